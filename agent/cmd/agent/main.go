@@ -3,15 +3,21 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/wangjialin/myops/agent/internal/collector"
 	"github.com/wangjialin/myops/agent/internal/config"
+	"github.com/wangjialin/myops/agent/internal/executor"
+	"github.com/wangjialin/myops/agent/internal/plugins"
 	"github.com/wangjialin/myops/agent/internal/reporter"
 )
 
@@ -20,89 +26,263 @@ var (
 	buildTime = "unknown"
 )
 
+// logFormat is how log entries are written: "text" (key=value) or "json"
+var logFormat = "text"
+
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	log.Printf("MyOps Agent v%s (built: %s)", version, buildTime)
+	configPath := config.DefaultConfigPath
+	if path := os.Getenv("MYOPS_AGENT_CONFIG"); path != "" {
+		configPath = path
+	}
+	if format := os.Getenv("MYOPS_AGENT_LOG_FORMAT"); format != "" {
+		logFormat = format
+	}
+	flag.StringVar(&configPath, "config", configPath, "configuration file path")
+	flag.StringVar(&logFormat, "log-format", logFormat, "log format: text or json")
+	flag.Parse()
+	setLogOutput(os.Stderr)
+
+	// start runs the agent the way the platform expects, or the given subcommand
+	if err := start(configPath, flag.Args()); err != nil {
+		slog.Error("agent failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// setLogOutput sends the structured log to w in logFormat. Entries written
+// with the log package are logged through it too.
+func setLogOutput(w io.Writer) {
+	opts := &slog.HandlerOptions{AddSource: true}
+	var handler slog.Handler = slog.NewTextHandler(w, opts)
+	if logFormat == "json" {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// runConsole runs the agent in the foreground until it is interrupted
+func runConsole(configPath string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return run(ctx, configPath)
+}
+
+// run runs the agent until ctx is done
+func run(ctx context.Context, configPath string) error {
+	slog.Info("starting MyOps Agent", "version", version, "build_time", buildTime)
 
 	// Load configuration
-	cfg, err := config.LoadOrDefault()
+	cfg, err := config.LoadOrDefault(configPath)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
 	// Validate configuration
 	if cfg.Server.Token == "" {
-		log.Fatal("Agent token is required. Set MYOPS_AGENT_TOKEN environment variable or configure in /etc/myops-agent/config.yaml")
+		return fmt.Errorf("agent token is required. Set MYOPS_AGENT_TOKEN environment variable or configure in %s", configPath)
+	}
+
+	// Settings the server pushed override the configuration file
+	overrides, err := config.LoadOverrides(cfg.OverridesPath)
+	if err != nil {
+		slog.Warn("ignoring the settings pushed by the server", "error", err)
+		overrides = &config.Overrides{}
 	}
+	overrides.Apply(cfg)
 
-	log.Printf("Configuration loaded:")
-	log.Printf("  Server: %s", cfg.Server.Endpoint)
-	log.Printf("  Report Interval: %d seconds", cfg.Report.Interval)
-	log.Printf("  Collect Network: %v", cfg.Collector.CollectNetwork)
+	slog.Info("configuration loaded",
+		"server", cfg.Server.Endpoint,
+		"grpc_server", cfg.Server.GRPCEndpoint,
+		"report_interval_seconds", cfg.Report.Interval,
+		"collect_network", cfg.Collector.CollectNetwork,
+		"commands_enabled", !cfg.Commands.Disabled,
+		"plugins_enabled", !cfg.Plugins.Disabled)
 
 	// Create collector
 	c := collector.NewCollector(cfg.Collector.CollectNetwork)
 
 	// Create reporter
 	r := reporter.NewReporter(cfg.Server.Endpoint, cfg.Server.Token, cfg.Server.Insecure)
+	if cfg.Server.GRPCEndpoint != "" {
+		if err := r.EnableGRPC(cfg.Server.GRPCEndpoint); err != nil {
+			slog.Warn("failed to set up gRPC, using HTTP", "error", err)
+		}
+	}
+	defer r.Close()
+	if err := r.SetCompression(cfg.Report.Compression); err != nil {
+		slog.Warn("sending reports uncompressed", "error", err)
+	}
+	if err := r.EnableBuffer(cfg.Report.BufferDir, cfg.Report.BufferMaxBytes, cfg.Report.BatchSize); err != nil {
+		slog.Warn("report buffering disabled", "error", err)
+	}
 
-	// Create context for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
+	// Stop everything started below when run returns
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	// Handle shutdown signals
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// Resend reports buffered while the server was unreachable
+	go r.Run(ctx)
+
+	// Start the plugins the server pushed before the agent last stopped
+	var pm *plugins.Manager
+	if !cfg.Plugins.Disabled {
+		pm = plugins.NewManager(cfg.Plugins.Dir, cfg.Plugins.StatePath, cfg.Plugins.User)
+		if err := pm.Load(); err != nil {
+			slog.Warn("failed to load plugins, waiting for the server to push them", "error", err)
+		}
+		pm.Start(ctx)
+	}
 
 	// Initial report
-	if err := reportOnce(c, r); err != nil {
-		log.Printf("Initial report failed: %v", err)
+	if err := reportOnce(c, r, pm); err != nil {
+		slog.Error("initial report failed", "error", err)
 	}
 
 	// Start periodic reporting
+	reportTicker := time.NewTicker(time.Duration(cfg.Report.Interval) * time.Second)
+	defer reportTicker.Stop()
 	go func() {
-		ticker := time.NewTicker(time.Duration(cfg.Report.Interval) * time.Second)
-		defer ticker.Stop()
-
 		for {
 			select {
 			case <-ctx.Done():
-				log.Println("Stopping reporter...")
+				slog.Info("stopping reporter")
 				return
-			case <-ticker.C:
-				if err := reportOnce(c, r); err != nil {
-					log.Printf("Report failed: %v", err)
+			case <-reportTicker.C:
+				if err := reportOnce(c, r, pm); err != nil {
+					slog.Error("report failed", "error", err)
 				}
 			}
 		}
 	}()
 
-	log.Println("Agent started successfully")
+	// Start heartbeats between reports, which only the gRPC service takes
+	var heartbeatTicker *time.Ticker
+	if cfg.Server.GRPCEndpoint != "" && cfg.Report.HeartbeatInterval > 0 {
+		heartbeatTicker = time.NewTicker(time.Duration(cfg.Report.HeartbeatInterval) * time.Second)
+		defer heartbeatTicker.Stop()
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-heartbeatTicker.C:
+					if err := r.Heartbeat(); err != nil && !errors.Is(err, reporter.ErrGRPCUnavailable) {
+						slog.Warn("heartbeat failed", "error", err)
+					}
+				}
+			}
+		}()
+	}
 
-	// Wait for shutdown signal
-	sig := <-sigChan
-	log.Printf("Received signal: %v", sig)
-	cancel()
+	// Start receiving server commands, streamed over the gRPC command channel while
+	// it is open and polled over HTTP otherwise
+	if !cfg.Commands.Disabled {
+		e := executor.NewExecutor()
+		if pm != nil {
+			e.SetPlugins(pm)
+		}
+		pollTicker := time.NewTicker(time.Duration(cfg.Commands.PollInterval) * time.Second)
+		defer pollTicker.Stop()
+
+		// Settings pushed by the server take effect at once and are kept for
+		// later runs
+		var mu sync.Mutex
+		e.SetConfigUpdater(func(update config.Overrides) (*config.Overrides, error) {
+			mu.Lock()
+			defer mu.Unlock()
 
-	log.Println("Agent stopped")
+			next := *overrides
+			next.Merge(update)
+			if err := next.Save(cfg.OverridesPath); err != nil {
+				return nil, err
+			}
+			overrides = &next
+			if update.ReportInterval != nil {
+				reportTicker.Reset(time.Duration(*update.ReportInterval) * time.Second)
+			}
+			if update.HeartbeatInterval != nil && heartbeatTicker != nil {
+				heartbeatTicker.Reset(time.Duration(*update.HeartbeatInterval) * time.Second)
+			}
+			if update.CommandPollInterval != nil {
+				pollTicker.Reset(time.Duration(*update.CommandPollInterval) * time.Second)
+			}
+			if update.CollectNetwork != nil {
+				c.SetCollectNetwork(*update.CollectNetwork)
+			}
+			effective := *cfg
+			next.Apply(&effective)
+			slog.Info("settings updated by the server",
+				"report_interval_seconds", effective.Report.Interval,
+				"heartbeat_interval_seconds", effective.Report.HeartbeatInterval,
+				"command_poll_interval_seconds", effective.Commands.PollInterval,
+				"collect_network", effective.Collector.CollectNetwork)
+			return &next, nil
+		})
+
+		go func() {
+			for {
+				err := r.RunCommandChannel(ctx, e.Execute)
+				if err != nil && ctx.Err() == nil && !errors.Is(err, reporter.ErrGRPCUnavailable) {
+					slog.Warn("command channel failed", "error", err)
+				}
+
+				select {
+				case <-ctx.Done():
+					slog.Info("stopping command poller")
+					return
+				case <-pollTicker.C:
+					if err := pollCommands(ctx, e, r); err != nil {
+						slog.Warn("command poll failed", "error", err)
+					}
+				}
+			}
+		}()
+	}
+
+	slog.Info("agent started")
+
+	// Wait for shutdown
+	<-ctx.Done()
+	slog.Info("agent stopped")
+	return nil
 }
 
-// reportOnce performs a single report
-func reportOnce(c *collector.Collector, r *reporter.Reporter) error {
-	log.Println("Collecting host information...")
+// reportOnce performs a single report, with the latest plugin output unless
+// plugins are disabled
+func reportOnce(c *collector.Collector, r *reporter.Reporter, pm *plugins.Manager) error {
+	slog.Debug("collecting host information")
 
 	hostInfo, err := c.Collect()
 	if err != nil {
 		return fmt.Errorf("collection failed: %w", err)
 	}
 
-	log.Printf("Collected info for host: %s (IP: %s)", hostInfo.Hostname, hostInfo.IPAddress)
+	slog.Debug("collected host information", "hostname", hostInfo.Hostname, "ip", hostInfo.IPAddress)
+	if pm != nil {
+		hostInfo.Plugins, hostInfo.PluginHash = pm.Results(), pm.Hash()
+	}
 
-	log.Println("Sending report to server...")
 	if err := r.Report(hostInfo); err != nil {
 		return fmt.Errorf("report failed: %w", err)
 	}
 
-	log.Println("Report sent successfully")
+	slog.Info("report sent", "hostname", hostInfo.Hostname)
+	return nil
+}
+
+// pollCommands fetches pending commands and executes them in order
+func pollCommands(ctx context.Context, e *executor.Executor, r *reporter.Reporter) error {
+	commands, err := r.FetchCommands()
+	if err != nil {
+		return err
+	}
+
+	for _, cmd := range commands {
+		slog.Info("executing command", "command_id", cmd.ID, "type", cmd.Type, "request_id", cmd.RequestID)
+		result := e.Execute(ctx, cmd)
+		if err := r.SubmitResult(cmd, result); err != nil {
+			slog.Error("failed to submit command result", "command_id", cmd.ID, "request_id", cmd.RequestID, "error", err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+// start runs the agent in the foreground; the init system supervises it
+func start(configPath string, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+	return runConsole(configPath)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/wangjialin/myops/agent/internal/config"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	// serviceName is the name the agent is installed under
+	serviceName = "myops-agent"
+	// maxLogSize is the size at which the service log is rotated on start
+	maxLogSize = 10 << 20
+)
+
+// start runs the agent as a Windows service when the service control manager
+// started it and in the foreground otherwise. The install and uninstall
+// commands register and remove the service.
+func start(configPath string, args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "install":
+			return installService(configPath)
+		case "uninstall":
+			return uninstallService()
+		default:
+			return fmt.Errorf("unknown command: %s", args[0])
+		}
+	}
+
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return fmt.Errorf("failed to detect the service control manager: %w", err)
+	}
+	if !isService {
+		return runConsole(configPath)
+	}
+
+	if err := logToFile(config.DefaultLogPath); err != nil {
+		return err
+	}
+	return svc.Run(serviceName, &agentService{configPath: configPath})
+}
+
+// agentService runs the agent under the service control manager
+type agentService struct {
+	configPath string
+}
+
+// Execute runs the agent until the service is stopped or the host shuts down
+func (s *agentService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, s.configPath) }()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				slog.Error("agent failed", "error", err)
+				return true, 1
+			}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// installService registers the running executable as an automatically started
+// service that is restarted when it fails
+func installService(configPath string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the agent executable: %w", err)
+	}
+	configPath, err = filepath.Abs(configPath)
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed", serviceName)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "MyOps Agent",
+		Description: "Reports host information to MyOps and runs its commands",
+		StartType:   mgr.StartAutomatic,
+	}, "-config", configPath)
+	if err != nil {
+		return fmt.Errorf("failed to install service: %w", err)
+	}
+	defer s.Close()
+
+	recovery := []mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+	}
+	if err := s.SetRecoveryActions(recovery, uint32((24 * time.Hour).Seconds())); err != nil {
+		slog.Warn("failed to set service recovery actions", "error", err)
+	}
+
+	slog.Info("installed service", "service", serviceName, "config", configPath)
+	return nil
+}
+
+// uninstallService removes the service; a running agent keeps running until
+// it is stopped
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to uninstall service: %w", err)
+	}
+	slog.Info("uninstalled service", "service", serviceName)
+	return nil
+}
+
+// logToFile sends the log to path, as services have no console. A log larger
+// than maxLogSize is kept as path.1 and a new one started.
+func logToFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() > maxLogSize {
+		os.Rename(path, path+".1")
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	setLogOutput(f)
+	return nil
+}
@@ -1,12 +1,23 @@
 module github.com/wangjialin/myops/agent
 
-go 1.23
+go 1.25.0
 
 require (
+	github.com/klauspost/compress v1.17.11
 	github.com/shirou/gopsutil/v3 v3.24.5
+	github.com/wangjialin/myops/pkg v0.0.0
+	golang.org/x/sys v0.40.0
+	google.golang.org/grpc v1.67.1
 	gopkg.in/yaml.v3 v3.0.1
 )
 
+require (
+	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/text v0.33.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+)
+
 require (
 	github.com/go-ole/go-ole v1.2.6 // indirect
 	github.com/lufia/plan9stats v0.0.0-20211012122336-39d0f177ccd0 // indirect
@@ -15,5 +26,6 @@ require (
 	github.com/tklauser/go-sysconf v0.3.12 // indirect
 	github.com/tklauser/numcpus v0.6.1 // indirect
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
-	golang.org/x/sys v0.20.0 // indirect
 )
+
+replace github.com/wangjialin/myops/pkg => ../backend/pkg
@@ -0,0 +1,116 @@
+# MyOps Agent Installation Script for Windows
+#
+# Run from an elevated PowerShell in the directory holding myops-agent.exe:
+#   .\install.ps1 -Endpoint https://myops.example.com -Token <agent token>
+
+param(
+    [string]$Endpoint = $env:MYOPS_SERVER_ENDPOINT,
+    [string]$Token = $env:MYOPS_AGENT_TOKEN,
+    [string]$GrpcEndpoint = $env:MYOPS_SERVER_GRPC_ENDPOINT
+)
+
+$ErrorActionPreference = "Stop"
+
+$Version = "1.0.0"
+$InstallDir = Join-Path $env:ProgramFiles "MyOps\Agent"
+$DataDir = Join-Path $env:ProgramData "MyOps\Agent"
+$ServiceName = "myops-agent"
+
+function Write-Info($Message) { Write-Host "[INFO] $Message" -ForegroundColor Green }
+function Write-Err($Message) { Write-Host "[ERROR] $Message" -ForegroundColor Red }
+
+# Check if running as administrator
+function Test-Admin {
+    $principal = New-Object Security.Principal.WindowsPrincipal([Security.Principal.WindowsIdentity]::GetCurrent())
+    if (-not $principal.IsInRole([Security.Principal.WindowsBuiltInRole]::Administrator)) {
+        Write-Err "This script must be run as administrator"
+        exit 1
+    }
+}
+
+# Get server endpoint from user
+function Get-Config {
+    if (-not $script:Endpoint) {
+        $script:Endpoint = Read-Host "Enter MyOps server endpoint (e.g., https://myops.example.com)"
+    }
+    if (-not $script:Token) {
+        $script:Token = Read-Host "Enter agent token"
+    }
+    if (-not $script:Endpoint -or -not $script:Token) {
+        Write-Err "Server endpoint and token are required"
+        exit 1
+    }
+}
+
+# Create the data directory, writable only by administrators and SYSTEM since
+# the agent runs plugins from it as SYSTEM
+function New-DataDir {
+    New-Item -ItemType Directory -Force -Path $DataDir | Out-Null
+    New-Item -ItemType Directory -Force -Path (Join-Path $DataDir "plugins") | Out-Null
+    icacls $DataDir /inheritance:r /grant:r "*S-1-5-18:(OI)(CI)F" "*S-1-5-32-544:(OI)(CI)F" | Out-Null
+}
+
+# Create config file
+function New-ConfigFile {
+    Write-Info "Creating configuration file..."
+
+    $config = @"
+# MyOps Agent Configuration
+server:
+  endpoint: "$Endpoint"
+  token: "$Token"
+  insecure: false
+  # gRPC agent service (host:port); reports fall back to the endpoint above
+  grpc_endpoint: "$GrpcEndpoint"
+
+report:
+  interval: 60
+
+collector:
+  collect_processes: false
+  collect_network: true
+"@
+    $path = Join-Path $DataDir "config.yaml"
+    Set-Content -Path $path -Value $config -Encoding UTF8
+    Write-Info "Configuration saved to $path"
+}
+
+# Install the agent as a Windows service
+function Install-AgentService {
+    Write-Info "Installing Windows service..."
+
+    if (Get-Service -Name $ServiceName -ErrorAction SilentlyContinue) {
+        Stop-Service -Name $ServiceName -ErrorAction SilentlyContinue
+        & (Join-Path $InstallDir "myops-agent.exe") uninstall
+    }
+
+    New-Item -ItemType Directory -Force -Path $InstallDir | Out-Null
+    Copy-Item -Force -Path (Join-Path $PSScriptRoot "myops-agent.exe") -Destination $InstallDir
+
+    & (Join-Path $InstallDir "myops-agent.exe") -config (Join-Path $DataDir "config.yaml") install
+    if ($LASTEXITCODE -ne 0) {
+        Write-Err "Service installation failed"
+        exit 1
+    }
+    Write-Info "Windows service installed"
+}
+
+# Main installation
+Write-Info "MyOps Agent Installer v$Version"
+Write-Host ""
+
+Test-Admin
+Get-Config
+New-DataDir
+New-ConfigFile
+Install-AgentService
+
+Write-Info "Starting $ServiceName service..."
+Start-Service -Name $ServiceName
+Get-Service -Name $ServiceName
+
+Write-Host ""
+Write-Info "Installation completed successfully!"
+Write-Info "To view logs: Get-Content -Wait $(Join-Path $DataDir 'agent.log')"
+Write-Info "To restart: Restart-Service $ServiceName"
+Write-Info "To stop: Stop-Service $ServiceName"
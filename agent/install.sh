@@ -92,6 +92,8 @@ server:
   endpoint: "$MYOPS_SERVER_ENDPOINT"
   token: "$MYOPS_AGENT_TOKEN"
   insecure: false
+  # gRPC agent service (host:port); reports fall back to the endpoint above
+  grpc_endpoint: "$MYOPS_SERVER_GRPC_ENDPOINT"
 
 report:
   interval: 60
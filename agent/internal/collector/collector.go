@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"net"
 	"runtime"
+	"sync/atomic"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/wangjialin/myops/agent/internal/plugins"
 )
 
 // HostInfo represents the collected host information
@@ -27,6 +31,32 @@ type HostInfo struct {
 	MemoryTotal uint64          `json:"memoryTotal"` // bytes
 	Disks      []DiskInfo       `json:"disks,omitempty"`
 	Networks   []NetworkInfo    `json:"networks,omitempty"`
+	Metrics    *HostMetrics     `json:"metrics,omitempty"`
+
+	// Plugins holds the latest output of each plugin, by plugin name, and
+	// PluginHash the server's hash of the plugin set the agent runs
+	Plugins    map[string]plugins.Result `json:"plugins,omitempty"`
+	PluginHash string                    `json:"pluginHash,omitempty"`
+}
+
+// HostMetrics represents the utilization sampled with each report
+type HostMetrics struct {
+	CPUUsagePercent float64          `json:"cpuUsagePercent"`
+	Load1           float64          `json:"load1"`
+	Load5           float64          `json:"load5"`
+	Load15          float64          `json:"load15"`
+	MemoryUsed      uint64           `json:"memoryUsed"`      // bytes
+	MemoryAvailable uint64           `json:"memoryAvailable"` // bytes
+	SwapUsed        uint64           `json:"swapUsed"`        // bytes
+	UptimeSeconds   uint64           `json:"uptimeSeconds"`
+	Networks        []NetworkCounter `json:"networks,omitempty"`
+}
+
+// NetworkCounter represents the traffic of an interface since boot
+type NetworkCounter struct {
+	Name      string `json:"name"`
+	BytesSent uint64 `json:"bytesSent"`
+	BytesRecv uint64 `json:"bytesRecv"`
 }
 
 // DiskInfo represents disk information
@@ -49,14 +79,19 @@ type NetworkInfo struct {
 
 // Collector collects system information
 type Collector struct {
-	collectNetwork bool
+	collectNetwork atomic.Bool
 }
 
 // NewCollector creates a new collector
 func NewCollector(collectNetwork bool) *Collector {
-	return &Collector{
-		collectNetwork: collectNetwork,
-	}
+	c := &Collector{}
+	c.collectNetwork.Store(collectNetwork)
+	return c
+}
+
+// SetCollectNetwork sets whether the next reports include network interfaces
+func (c *Collector) SetCollectNetwork(collectNetwork bool) {
+	c.collectNetwork.Store(collectNetwork)
 }
 
 // Collect collects all system information
@@ -92,6 +127,9 @@ func (c *Collector) Collect() (*HostInfo, error) {
 		info.MemoryTotal = memInfo.Total
 	}
 
+	// Get utilization
+	info.Metrics = c.collectMetrics(hostInfo.Uptime)
+
 	// Get primary IP address
 	ip, err := c.getPrimaryIP()
 	if err == nil {
@@ -99,7 +137,7 @@ func (c *Collector) Collect() (*HostInfo, error) {
 	}
 
 	// Get network interfaces
-	if c.collectNetwork {
+	if c.collectNetwork.Load() {
 		networks, err := c.collectNetworkInfo()
 		if err == nil {
 			info.Networks = networks
@@ -128,6 +166,61 @@ func (c *Collector) Collect() (*HostInfo, error) {
 	return info, nil
 }
 
+// collectMetrics samples CPU, load, memory and network utilization. Values that
+// cannot be read on the platform are left at zero.
+func (c *Collector) collectMetrics(uptime uint64) *HostMetrics {
+	metrics := &HostMetrics{UptimeSeconds: uptime}
+
+	// CPU usage since the previous call; the first call measures since boot
+	if percent, err := cpu.Percent(0, false); err == nil && len(percent) > 0 {
+		metrics.CPUUsagePercent = percent[0]
+	}
+
+	if avg, err := load.Avg(); err == nil {
+		metrics.Load1 = avg.Load1
+		metrics.Load5 = avg.Load5
+		metrics.Load15 = avg.Load15
+	}
+
+	if memInfo, err := mem.VirtualMemory(); err == nil {
+		metrics.MemoryUsed = memInfo.Used
+		metrics.MemoryAvailable = memInfo.Available
+	}
+	if swap, err := mem.SwapMemory(); err == nil {
+		metrics.SwapUsed = swap.Used
+	}
+
+	if counters, err := psnet.IOCounters(true); err == nil {
+		loopbacks := loopbackInterfaces()
+		for _, counter := range counters {
+			if loopbacks[counter.Name] {
+				continue
+			}
+			metrics.Networks = append(metrics.Networks, NetworkCounter{
+				Name:      counter.Name,
+				BytesSent: counter.BytesSent,
+				BytesRecv: counter.BytesRecv,
+			})
+		}
+	}
+
+	return metrics
+}
+
+// loopbackInterfaces returns the names of the loopback interfaces, which are
+// named differently on each platform
+func loopbackInterfaces() map[string]bool {
+	loopbacks := map[string]bool{"lo": true}
+	if interfaces, err := net.Interfaces(); err == nil {
+		for _, iface := range interfaces {
+			if iface.Flags&net.FlagLoopback != 0 {
+				loopbacks[iface.Name] = true
+			}
+		}
+	}
+	return loopbacks
+}
+
 // getPrimaryIP gets the primary IP address
 func (c *Collector) getPrimaryIP() (string, error) {
 	conn, err := net.Dial("udp", "8.8.8.8:80")
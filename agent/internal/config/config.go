@@ -13,6 +13,11 @@ type Config struct {
 	Server   ServerConfig   `yaml:"server"`
 	Report   ReportConfig   `yaml:"report"`
 	Collector CollectorConfig `yaml:"collector"`
+	Commands CommandsConfig  `yaml:"commands"`
+	Plugins  PluginsConfig   `yaml:"plugins"`
+
+	// OverridesPath is where the settings the server pushed are kept
+	OverridesPath string `yaml:"overrides_path"`
 }
 
 // ServerConfig represents the server connection configuration
@@ -20,11 +25,23 @@ type ServerConfig struct {
 	Endpoint string `yaml:"endpoint"`
 	Token    string `yaml:"token"`
 	Insecure bool   `yaml:"insecure"`
+
+	// GRPCEndpoint is the host:port of the gateway's gRPC agent service. Reports and
+	// commands fall back to Endpoint while it cannot be reached; empty uses HTTP only.
+	GRPCEndpoint string `yaml:"grpc_endpoint"`
 }
 
 // ReportConfig represents the reporting configuration
 type ReportConfig struct {
-	Interval int `yaml:"interval"` // seconds
+	Interval          int `yaml:"interval"`           // seconds
+	HeartbeatInterval int `yaml:"heartbeat_interval"` // seconds, sent between reports over gRPC
+
+	// Reports the server does not take are buffered in BufferDir and resent in
+	// batches of BatchSize; the oldest are dropped beyond BufferMaxBytes
+	BufferDir      string `yaml:"buffer_dir"`
+	BufferMaxBytes int64  `yaml:"buffer_max_bytes"`
+	BatchSize      int    `yaml:"batch_size"`
+	Compression    string `yaml:"compression"` // gzip, zstd or none, for HTTP reports
 }
 
 // CollectorConfig represents the collector configuration
@@ -33,11 +50,34 @@ type CollectorConfig struct {
 	CollectNetwork   bool `yaml:"collect_network"`
 }
 
+// PluginsConfig represents the custom collector plugin configuration. The server
+// pushes which plugins to run; only executables in Dir can be run.
+type PluginsConfig struct {
+	Disabled  bool   `yaml:"disabled"`
+	Dir       string `yaml:"dir"`
+	StatePath string `yaml:"state_path"` // where the pushed plugin set is kept
+	User      string `yaml:"user"`       // unprivileged user plugins run as, if set
+}
+
+// CommandsConfig represents the command channel configuration
+type CommandsConfig struct {
+	Disabled     bool `yaml:"disabled"`      // stop accepting commands from the server
+	PollInterval int  `yaml:"poll_interval"` // seconds
+}
+
 const (
-	// DefaultConfigPath is the default configuration file path
-	DefaultConfigPath = "/etc/myops-agent/config.yaml"
 	// DefaultReportInterval is the default reporting interval in seconds
 	DefaultReportInterval = 60
+	// DefaultHeartbeatInterval is the default gRPC heartbeat interval in seconds
+	DefaultHeartbeatInterval = 20
+	// DefaultBufferMaxBytes is the default size cap of the report buffer
+	DefaultBufferMaxBytes = 64 << 20
+	// DefaultBatchSize is the default number of buffered reports sent per request
+	DefaultBatchSize = 20
+	// DefaultCompression is the default compression of HTTP reports
+	DefaultCompression = "gzip"
+	// DefaultCommandPollInterval is the default command polling interval in seconds
+	DefaultCommandPollInterval = 5
 	// DefaultEndpoint is the default server endpoint
 	DefaultEndpoint = "https://localhost:8080"
 )
@@ -58,9 +98,36 @@ func Load(path string) (*Config, error) {
 	if cfg.Report.Interval == 0 {
 		cfg.Report.Interval = DefaultReportInterval
 	}
+	if cfg.Report.HeartbeatInterval == 0 {
+		cfg.Report.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if cfg.Report.BufferDir == "" {
+		cfg.Report.BufferDir = DefaultBufferDir
+	}
+	if cfg.Report.BufferMaxBytes == 0 {
+		cfg.Report.BufferMaxBytes = DefaultBufferMaxBytes
+	}
+	if cfg.Report.BatchSize == 0 {
+		cfg.Report.BatchSize = DefaultBatchSize
+	}
+	if cfg.Report.Compression == "" {
+		cfg.Report.Compression = DefaultCompression
+	}
 	if cfg.Server.Endpoint == "" {
 		cfg.Server.Endpoint = DefaultEndpoint
 	}
+	if cfg.Commands.PollInterval == 0 {
+		cfg.Commands.PollInterval = DefaultCommandPollInterval
+	}
+	if cfg.Plugins.Dir == "" {
+		cfg.Plugins.Dir = DefaultPluginDir
+	}
+	if cfg.Plugins.StatePath == "" {
+		cfg.Plugins.StatePath = DefaultPluginStatePath
+	}
+	if cfg.OverridesPath == "" {
+		cfg.OverridesPath = DefaultOverridesPath
+	}
 
 	// Validate
 	if cfg.Server.Token == "" {
@@ -70,10 +137,10 @@ func Load(path string) (*Config, error) {
 	return &cfg, nil
 }
 
-// LoadOrDefault loads the config from default path or returns default config
-func LoadOrDefault() (*Config, error) {
-	// Try to load from default path
-	if cfg, err := Load(DefaultConfigPath); err == nil {
+// LoadOrDefault loads the config from path or returns default config
+func LoadOrDefault(path string) (*Config, error) {
+	// Try to load from the config file
+	if cfg, err := Load(path); err == nil {
 		return cfg, nil
 	}
 
@@ -83,13 +150,31 @@ func LoadOrDefault() (*Config, error) {
 			Endpoint: os.Getenv("MYOPS_SERVER_ENDPOINT"),
 			Token:    os.Getenv("MYOPS_AGENT_TOKEN"),
 			Insecure: os.Getenv("MYOPS_SERVER_INSECURE") == "true",
+
+			GRPCEndpoint: os.Getenv("MYOPS_SERVER_GRPC_ENDPOINT"),
 		},
 		Report: ReportConfig{
-			Interval: DefaultReportInterval,
+			Interval:          DefaultReportInterval,
+			HeartbeatInterval: DefaultHeartbeatInterval,
+			BufferDir:         DefaultBufferDir,
+			BufferMaxBytes:    DefaultBufferMaxBytes,
+			BatchSize:         DefaultBatchSize,
+			Compression:       DefaultCompression,
 		},
 		Collector: CollectorConfig{
 			CollectProcesses: false,
 			CollectNetwork:   true,
 		},
+		Commands: CommandsConfig{
+			Disabled:     os.Getenv("MYOPS_AGENT_COMMANDS_DISABLED") == "true",
+			PollInterval: DefaultCommandPollInterval,
+		},
+		Plugins: PluginsConfig{
+			Disabled:  os.Getenv("MYOPS_AGENT_PLUGINS_DISABLED") == "true",
+			Dir:       DefaultPluginDir,
+			StatePath: DefaultPluginStatePath,
+			User:      os.Getenv("MYOPS_AGENT_PLUGINS_USER"),
+		},
+		OverridesPath: DefaultOverridesPath,
 	}, nil
 }
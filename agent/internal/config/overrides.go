@@ -0,0 +1,105 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Overrides are the settings the server pushed, kept in OverridesPath so they
+// survive restarts. They take precedence over the configuration file; unset
+// settings keep its value.
+type Overrides struct {
+	ReportInterval      *int  `json:"reportInterval,omitempty"`      // seconds
+	HeartbeatInterval   *int  `json:"heartbeatInterval,omitempty"`   // seconds
+	CommandPollInterval *int  `json:"commandPollInterval,omitempty"` // seconds
+	CollectNetwork      *bool `json:"collectNetwork,omitempty"`
+}
+
+// Merge sets the settings set in update
+func (o *Overrides) Merge(update Overrides) {
+	if update.ReportInterval != nil {
+		o.ReportInterval = update.ReportInterval
+	}
+	if update.HeartbeatInterval != nil {
+		o.HeartbeatInterval = update.HeartbeatInterval
+	}
+	if update.CommandPollInterval != nil {
+		o.CommandPollInterval = update.CommandPollInterval
+	}
+	if update.CollectNetwork != nil {
+		o.CollectNetwork = update.CollectNetwork
+	}
+}
+
+// Validate checks that the intervals set are positive
+func (o *Overrides) Validate() error {
+	for name, interval := range map[string]*int{
+		"reportInterval":      o.ReportInterval,
+		"heartbeatInterval":   o.HeartbeatInterval,
+		"commandPollInterval": o.CommandPollInterval,
+	} {
+		if interval != nil && *interval <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+	return nil
+}
+
+// Apply sets the overridden settings on cfg
+func (o *Overrides) Apply(cfg *Config) {
+	if o.ReportInterval != nil {
+		cfg.Report.Interval = *o.ReportInterval
+	}
+	if o.HeartbeatInterval != nil {
+		cfg.Report.HeartbeatInterval = *o.HeartbeatInterval
+	}
+	if o.CommandPollInterval != nil {
+		cfg.Commands.PollInterval = *o.CommandPollInterval
+	}
+	if o.CollectNetwork != nil {
+		cfg.Collector.CollectNetwork = *o.CollectNetwork
+	}
+}
+
+// LoadOverrides reads the settings the server pushed. A missing file holds none.
+func LoadOverrides(path string) (*Overrides, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Overrides{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read overrides: %w", err)
+	}
+
+	var o Overrides
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("failed to parse overrides: %w", err)
+	}
+	if err := o.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid overrides: %w", err)
+	}
+	return &o, nil
+}
+
+// Save writes the overrides to path, replacing the previous ones at once
+func (o *Overrides) Save(path string) error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("failed to encode overrides: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to save overrides: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save overrides: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save overrides: %w", err)
+	}
+	return nil
+}
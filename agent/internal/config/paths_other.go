@@ -0,0 +1,17 @@
+//go:build !windows
+
+package config
+
+// Default file locations
+const (
+	// DefaultConfigPath is the default configuration file path
+	DefaultConfigPath = "/etc/myops-agent/config.yaml"
+	// DefaultBufferDir is the default directory unsent reports are buffered in
+	DefaultBufferDir = "/var/lib/myops-agent/reports"
+	// DefaultPluginDir is the default directory plugin executables are run from
+	DefaultPluginDir = "/usr/lib/myops-agent/plugins"
+	// DefaultPluginStatePath is the default file the pushed plugin set is kept in
+	DefaultPluginStatePath = "/var/lib/myops-agent/plugins.json"
+	// DefaultOverridesPath is the default file the settings pushed by the server are kept in
+	DefaultOverridesPath = "/var/lib/myops-agent/overrides.json"
+)
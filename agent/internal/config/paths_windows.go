@@ -0,0 +1,33 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Default file locations, all under %ProgramData%\MyOps\Agent, which
+// install.ps1 restricts to administrators and SYSTEM
+var (
+	// DataDir is the directory the agent keeps its configuration and state in
+	DataDir = filepath.Join(programData(), "MyOps", "Agent")
+	// DefaultConfigPath is the default configuration file path
+	DefaultConfigPath = filepath.Join(DataDir, "config.yaml")
+	// DefaultBufferDir is the default directory unsent reports are buffered in
+	DefaultBufferDir = filepath.Join(DataDir, "reports")
+	// DefaultPluginDir is the default directory plugin executables are run from
+	DefaultPluginDir = filepath.Join(DataDir, "plugins")
+	// DefaultPluginStatePath is the default file the pushed plugin set is kept in
+	DefaultPluginStatePath = filepath.Join(DataDir, "plugins.json")
+	// DefaultOverridesPath is the default file the settings pushed by the server are kept in
+	DefaultOverridesPath = filepath.Join(DataDir, "overrides.json")
+	// DefaultLogPath is the file the agent logs to when run as a Windows service
+	DefaultLogPath = filepath.Join(DataDir, "agent.log")
+)
+
+// programData returns the machine-wide application data directory
+func programData() string {
+	if dir := os.Getenv("ProgramData"); dir != "" {
+		return dir
+	}
+	return `C:\ProgramData`
+}
@@ -0,0 +1,218 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CommandComplianceScan evaluates host compliance probes sent by the server
+const CommandComplianceScan = "compliance_scan"
+
+// sshdConfigPath is read when sshd -T is unavailable
+const sshdConfigPath = "/etc/ssh/sshd_config"
+
+// Probe outcomes
+const (
+	probePass    = "pass"
+	probeFail    = "fail"
+	probeSkipped = "skipped"
+	probeError   = "error"
+)
+
+// complianceProbe is one check to evaluate. The server decides what is checked;
+// the agent only reads the host's state and compares it.
+type complianceProbe struct {
+	ID       string   `json:"id"`
+	Kind     string   `json:"kind"` // sshd, file or sysctl
+	Key      string   `json:"key"`
+	Expected []string `json:"expected"`
+	Default  string   `json:"default"`
+	Max      *int     `json:"max"`
+	Path     string   `json:"path"`
+	MaxMode  string   `json:"maxMode"`
+	Owner    string   `json:"owner"`
+	Groups   []string `json:"groups"`
+}
+
+// ProbeResult is the outcome of a probe as reported to the server
+type ProbeResult struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Evidence string `json:"evidence"`
+}
+
+// complianceArgs are the arguments of the compliance scan command
+type complianceArgs struct {
+	Probes []complianceProbe `json:"probes"`
+}
+
+// scanCompliance evaluates every probe. A probe that cannot be evaluated is
+// reported with the error status rather than failing the scan.
+func scanCompliance(ctx context.Context, raw json.RawMessage) ([]ProbeResult, error) {
+	var args complianceArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	var sshd map[string]string
+	var sshdErr error
+	sshdLoaded := false
+
+	results := make([]ProbeResult, 0, len(args.Probes))
+	for _, probe := range args.Probes {
+		var result ProbeResult
+		switch probe.Kind {
+		case "sshd":
+			if !sshdLoaded {
+				sshd, sshdErr = loadSSHDConfig(ctx)
+				sshdLoaded = true
+			}
+			result = probeSSHD(probe, sshd, sshdErr)
+		case "file":
+			result = probeFile(probe)
+		case "sysctl":
+			result = probeSysctl(probe)
+		default:
+			result = ProbeResult{Status: probeError, Evidence: fmt.Sprintf("unsupported probe kind %q", probe.Kind)}
+		}
+		result.ID = probe.ID
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// loadSSHDConfig returns sshd's effective options, lowercased. sshd -T resolves
+// includes and defaults; the config file is parsed when it cannot run.
+func loadSSHDConfig(ctx context.Context) (map[string]string, error) {
+	if out, err := exec.CommandContext(ctx, "sshd", "-T").Output(); err == nil {
+		return parseSSHDOptions(string(out)), nil
+	}
+
+	data, err := os.ReadFile(sshdConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseSSHDOptions(string(data)), nil
+}
+
+// parseSSHDOptions reads "Option value" lines. The first value of an option wins,
+// as it does for sshd, and Match blocks are ignored.
+func parseSSHDOptions(config string) map[string]string {
+	options := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		key := strings.ToLower(fields[0])
+		if key == "match" {
+			break
+		}
+		if _, ok := options[key]; ok || len(fields) < 2 {
+			continue
+		}
+		options[key] = strings.Join(fields[1:], " ")
+	}
+	return options
+}
+
+func probeSSHD(probe complianceProbe, options map[string]string, loadErr error) ProbeResult {
+	if loadErr != nil {
+		if os.IsNotExist(loadErr) {
+			return ProbeResult{Status: probeSkipped, Evidence: "sshd is not installed"}
+		}
+		return ProbeResult{Status: probeError, Evidence: fmt.Sprintf("failed to read sshd config: %v", loadErr)}
+	}
+
+	key := strings.ToLower(probe.Key)
+	value, ok := options[key]
+	if !ok {
+		value = probe.Default
+	}
+	evidence := fmt.Sprintf("%s %s", probe.Key, value)
+	if !ok {
+		evidence += " (default)"
+	}
+
+	if probe.Max != nil {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return ProbeResult{Status: probeError, Evidence: evidence}
+		}
+		if n > *probe.Max {
+			return ProbeResult{Status: probeFail, Evidence: evidence}
+		}
+		return ProbeResult{Status: probePass, Evidence: evidence}
+	}
+	return matchExpected(value, probe.Expected, evidence)
+}
+
+func probeFile(probe complianceProbe) ProbeResult {
+	info, err := os.Stat(probe.Path)
+	if os.IsNotExist(err) {
+		return ProbeResult{Status: probeSkipped, Evidence: fmt.Sprintf("%s does not exist", probe.Path)}
+	}
+	if err != nil {
+		return ProbeResult{Status: probeError, Evidence: err.Error()}
+	}
+
+	mode := info.Mode().Perm()
+	owner, group := fileOwner(probe.Path, info)
+	evidence := fmt.Sprintf("%s %04o %s:%s", filepath.Clean(probe.Path), mode, owner, group)
+
+	if probe.MaxMode != "" {
+		max, err := strconv.ParseUint(probe.MaxMode, 8, 32)
+		if err != nil {
+			return ProbeResult{Status: probeError, Evidence: fmt.Sprintf("invalid mode %q", probe.MaxMode)}
+		}
+		// Any permission bit beyond the allowed ones is too permissive
+		if uint32(mode)&^uint32(max) != 0 {
+			return ProbeResult{Status: probeFail, Evidence: evidence}
+		}
+	}
+	if probe.Owner != "" && owner != probe.Owner {
+		return ProbeResult{Status: probeFail, Evidence: evidence}
+	}
+	if len(probe.Groups) > 0 && !containsFold(probe.Groups, group) {
+		return ProbeResult{Status: probeFail, Evidence: evidence}
+	}
+	return ProbeResult{Status: probePass, Evidence: evidence}
+}
+
+func probeSysctl(probe complianceProbe) ProbeResult {
+	path := filepath.Join("/proc/sys", strings.ReplaceAll(probe.Key, ".", "/"))
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ProbeResult{Status: probeSkipped, Evidence: fmt.Sprintf("%s is not available", probe.Key)}
+	}
+	if err != nil {
+		return ProbeResult{Status: probeError, Evidence: err.Error()}
+	}
+	value := strings.Join(strings.Fields(string(data)), " ")
+	return matchExpected(value, probe.Expected, fmt.Sprintf("%s = %s", probe.Key, value))
+}
+
+func matchExpected(value string, expected []string, evidence string) ProbeResult {
+	if containsFold(expected, value) {
+		return ProbeResult{Status: probePass, Evidence: evidence}
+	}
+	return ProbeResult{Status: probeFail, Evidence: evidence}
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
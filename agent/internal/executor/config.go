@@ -0,0 +1,37 @@
+package executor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/wangjialin/myops/agent/internal/config"
+)
+
+// CommandConfigUpdate changes the agent settings the server manages
+const CommandConfigUpdate = "config_update"
+
+// ConfigUpdater applies settings pushed by the server and returns every setting
+// now overridden
+type ConfigUpdater func(update config.Overrides) (*config.Overrides, error)
+
+// SetConfigUpdater sets what config_update commands apply their settings with
+func (e *Executor) SetConfigUpdater(updater ConfigUpdater) {
+	e.updateConfig = updater
+}
+
+// applyConfigUpdate applies the settings of a config_update command
+func (e *Executor) applyConfigUpdate(rawArgs json.RawMessage) (*config.Overrides, error) {
+	if e.updateConfig == nil {
+		return nil, errors.New("remote configuration is disabled on this agent")
+	}
+
+	var update config.Overrides
+	if err := json.Unmarshal(rawArgs, &update); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if err := update.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	return e.updateConfig(update)
+}
@@ -0,0 +1,181 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Scheduled job command types
+const (
+	CommandCrontabRead     = "crontab_read"
+	CommandCrontabWrite    = "crontab_write"
+	CommandTimerList       = "timer_list"
+	CommandCalendarPreview = "calendar_preview"
+)
+
+// crontabUserPattern matches valid system user names
+var crontabUserPattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// TimerInfo represents a systemd timer as reported to the server
+type TimerInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	ActiveState string `json:"activeState"`
+	Unit        string `json:"unit,omitempty"`
+	Calendar    string `json:"calendar,omitempty"`
+	NextElapse  string `json:"nextElapse,omitempty"`
+	LastTrigger string `json:"lastTrigger,omitempty"`
+}
+
+// crontabArgs are the arguments of the crontab commands
+type crontabArgs struct {
+	User    string `json:"user"`
+	Content string `json:"content"`
+}
+
+// parseCrontabArgs decodes and validates crontab command arguments
+func parseCrontabArgs(rawArgs json.RawMessage) (*crontabArgs, error) {
+	var args crontabArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if !crontabUserPattern.MatchString(args.User) {
+		return nil, fmt.Errorf("invalid crontab user: %s", args.User)
+	}
+	return &args, nil
+}
+
+// readCrontab returns a user's crontab content; a user without a crontab has empty content
+func readCrontab(ctx context.Context, rawArgs json.RawMessage) (map[string]string, error) {
+	args, err := parseCrontabArgs(rawArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := run(ctx, "crontab", "-l", "-u", args.User)
+	if err != nil {
+		if strings.Contains(err.Error(), "no crontab for") {
+			return map[string]string{"content": ""}, nil
+		}
+		return nil, err
+	}
+	return map[string]string{"content": out}, nil
+}
+
+// writeCrontab replaces a user's crontab
+func writeCrontab(ctx context.Context, rawArgs json.RawMessage) error {
+	args, err := parseCrontabArgs(rawArgs)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(args.Content) == "" {
+		// crontab refuses empty input; remove the crontab instead
+		_, err := run(ctx, "crontab", "-r", "-u", args.User)
+		if err != nil && strings.Contains(err.Error(), "no crontab for") {
+			return nil
+		}
+		return err
+	}
+
+	_, err = runWithInput(ctx, args.Content, "crontab", "-u", args.User, "-")
+	return err
+}
+
+// listTimers returns all systemd timers on the host
+func listTimers(ctx context.Context) ([]TimerInfo, error) {
+	out, err := run(ctx, "systemctl", "list-units", "--type=timer", "--all", "--no-legend", "--no-pager", "--plain")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	timers := []TimerInfo{}
+	if len(names) == 0 {
+		return timers, nil
+	}
+
+	showArgs := append([]string{"show", "--no-pager",
+		"--property=Id,Description,ActiveState,Unit,TimersCalendar,NextElapseUSecRealtime,LastTriggerUSec", "--"}, names...)
+	out, err = run(ctx, "systemctl", showArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	// systemctl show separates units with blank lines
+	for _, block := range strings.Split(strings.TrimSpace(out), "\n\n") {
+		var timer TimerInfo
+		for _, line := range strings.Split(block, "\n") {
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			switch key {
+			case "Id":
+				timer.Name = value
+			case "Description":
+				timer.Description = value
+			case "ActiveState":
+				timer.ActiveState = value
+			case "Unit":
+				timer.Unit = value
+			case "TimersCalendar":
+				timer.Calendar = value
+			case "NextElapseUSecRealtime":
+				timer.NextElapse = value
+			case "LastTriggerUSec":
+				timer.LastTrigger = value
+			}
+		}
+		if timer.Name != "" {
+			timers = append(timers, timer)
+		}
+	}
+	return timers, nil
+}
+
+// previewCalendar validates an OnCalendar expression and returns its next elapse times
+func previewCalendar(ctx context.Context, rawArgs json.RawMessage) ([]string, error) {
+	var args struct {
+		Expression string `json:"expression"`
+		Iterations int    `json:"iterations"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if strings.TrimSpace(args.Expression) == "" {
+		return nil, fmt.Errorf("calendar expression is empty")
+	}
+	if args.Iterations <= 0 || args.Iterations > 20 {
+		args.Iterations = 5
+	}
+
+	out, err := run(ctx, "systemd-analyze", "calendar", "--iterations="+strconv.Itoa(args.Iterations), "--", args.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	// Next elapse: Thu 2026-10-15 00:00:00 UTC
+	//    Iter. #2: Fri 2026-10-16 00:00:00 UTC
+	next := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if key == "Next elapse" || strings.HasPrefix(key, "Iter. #") {
+			next = append(next, strings.TrimSpace(value))
+		}
+	}
+	return next, nil
+}
@@ -0,0 +1,555 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Network diagnostic command types
+const (
+	CommandNetworkDiagnostic = "network_diagnostic"
+	CommandBandwidthServer   = "bandwidth_server"
+)
+
+const (
+	// tcpConnectTimeout limits each attempt of a tcp diagnostic
+	tcpConnectTimeout = 5 * time.Second
+	// bandwidthAcceptWindow is how long past a bandwidth test's duration its
+	// server waits for the client to connect
+	bandwidthAcceptWindow = time.Minute
+	// bandwidthReportTimeout is how long a bandwidth client waits for the
+	// server's count once it stopped sending
+	bandwidthReportTimeout = 10 * time.Second
+)
+
+// diagnosticTargetPattern matches host names, addresses and DNS names. Targets
+// are passed to dig, traceroute and mtr, so a leading dash is refused.
+var diagnosticTargetPattern = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._:\-]{0,252}$`)
+
+// networkDiagnosticSpec is what the server asks to test
+type networkDiagnosticSpec struct {
+	Type       string `json:"type"` // dns, traceroute, mtr, tcp or bandwidth
+	Target     string `json:"target"`
+	Port       int    `json:"port,omitempty"`
+	RecordType string `json:"recordType,omitempty"`
+	Server     string `json:"server,omitempty"`
+	Trace      bool   `json:"trace,omitempty"`
+	Count      int    `json:"count,omitempty"`
+	MaxHops    int    `json:"maxHops,omitempty"`
+	Duration   int    `json:"duration,omitempty"` // seconds
+	Token      string `json:"token,omitempty"`
+}
+
+// DNSRecord is a record a lookup returned, as reported to the server
+type DNSRecord struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// DNSLookupResult is the result of a dns diagnostic
+type DNSLookupResult struct {
+	Server     string      `json:"server,omitempty"`
+	RecordType string      `json:"recordType"`
+	Records    []DNSRecord `json:"records"`
+	Latency    float64     `json:"latency"` // milliseconds
+	Trace      string      `json:"trace,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// TraceHop is a hop of a traceroute or mtr report
+type TraceHop struct {
+	Hop      int     `json:"hop"`
+	Address  string  `json:"address,omitempty"`
+	Hostname string  `json:"hostname,omitempty"`
+	Sent     int     `json:"sent"`
+	Loss     float64 `json:"loss"` // percent
+	Last     float64 `json:"last,omitempty"`
+	Best     float64 `json:"best,omitempty"`
+	Avg      float64 `json:"avg,omitempty"`
+	Worst    float64 `json:"worst,omitempty"`
+}
+
+// TraceResult is the result of a traceroute or mtr diagnostic
+type TraceResult struct {
+	Hops    []TraceHop `json:"hops"`
+	Reached bool       `json:"reached"`
+	Output  string     `json:"output,omitempty"`
+}
+
+// TCPConnectAttempt is one connection attempt of a tcp diagnostic
+type TCPConnectAttempt struct {
+	Latency float64 `json:"latency"` // milliseconds
+	Error   string  `json:"error,omitempty"`
+}
+
+// TCPConnectResult is the result of a tcp diagnostic
+type TCPConnectResult struct {
+	Address   string              `json:"address,omitempty"`
+	Attempts  []TCPConnectAttempt `json:"attempts"`
+	Succeeded int                 `json:"succeeded"`
+}
+
+// BandwidthResult is what the server of a bandwidth test received
+type BandwidthResult struct {
+	Bytes         int64   `json:"bytes"`
+	Seconds       float64 `json:"seconds"`
+	BitsPerSecond float64 `json:"bitsPerSecond"`
+}
+
+// bandwidthServerSpec is the bandwidth test a server accepts
+type bandwidthServerSpec struct {
+	Port     int    `json:"port"`
+	Token    string `json:"token"`
+	Duration int    `json:"duration"` // seconds
+}
+
+// networkDiagnostic runs a network test. A target that fails the test, such
+// as a name that does not resolve, is reported in the result.
+func networkDiagnostic(ctx context.Context, rawArgs json.RawMessage) (interface{}, error) {
+	var spec networkDiagnosticSpec
+	if err := json.Unmarshal(rawArgs, &spec); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if !diagnosticTargetPattern.MatchString(spec.Target) {
+		return nil, fmt.Errorf("invalid target: %s", spec.Target)
+	}
+
+	switch spec.Type {
+	case "dns":
+		return dnsLookup(ctx, &spec)
+	case "traceroute":
+		return traceroute(ctx, &spec)
+	case "mtr":
+		return mtrReport(ctx, &spec)
+	case "tcp":
+		return tcpConnect(ctx, &spec)
+	case "bandwidth":
+		return bandwidthTest(ctx, &spec)
+	}
+	return nil, fmt.Errorf("unknown diagnostic type: %s", spec.Type)
+}
+
+// dnsLookup resolves the target with the host's resolver or the given server,
+// and traces its delegation from the root with dig when asked to
+func dnsLookup(ctx context.Context, spec *networkDiagnosticSpec) (*DNSLookupResult, error) {
+	if spec.Server != "" && !diagnosticTargetPattern.MatchString(spec.Server) {
+		return nil, fmt.Errorf("invalid server: %s", spec.Server)
+	}
+
+	resolver := net.DefaultResolver
+	if spec.Server != "" {
+		server := spec.Server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	result := &DNSLookupResult{Server: spec.Server, RecordType: spec.RecordType, Records: []DNSRecord{}}
+	started := time.Now()
+	records, err := lookupRecords(ctx, resolver, spec.RecordType, spec.Target)
+	result.Latency = milliseconds(time.Since(started))
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Records = records
+	}
+
+	if spec.Trace {
+		out, err := run(ctx, "dig", "+trace", "+nodnssec", spec.Target, spec.RecordType)
+		if err != nil {
+			out = err.Error()
+		}
+		result.Trace = out
+	}
+	return result, nil
+}
+
+// lookupRecords looks up the records of a type
+func lookupRecords(ctx context.Context, resolver *net.Resolver, recordType, name string) ([]DNSRecord, error) {
+	var records []DNSRecord
+	add := func(value string) {
+		records = append(records, DNSRecord{Type: recordType, Value: value})
+	}
+
+	switch recordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			add(ip.String())
+		}
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		add(cname)
+	case "MX":
+		mxs, err := resolver.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			add(fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+		}
+	case "NS":
+		nss, err := resolver.LookupNS(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range nss {
+			add(ns.Host)
+		}
+	case "TXT":
+		txts, err := resolver.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, txt := range txts {
+			add(txt)
+		}
+	case "PTR":
+		names, err := resolver.LookupAddr(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range names {
+			add(n)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported record type: %s", recordType)
+	}
+	return records, nil
+}
+
+// traceHopPattern matches the hop number at the start of a traceroute line
+var traceHopPattern = regexp.MustCompile(`^\s*(\d+)\s+(.*)$`)
+
+// traceroute runs traceroute with one probe per hop
+func traceroute(ctx context.Context, spec *networkDiagnosticSpec) (*TraceResult, error) {
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("traceroute is not supported on %s", runtime.GOOS)
+	}
+	targets, err := resolveTarget(ctx, spec.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := run(ctx, "traceroute", "-q", "1", "-w", "2", "-m", strconv.Itoa(spec.MaxHops), spec.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TraceResult{Hops: []TraceHop{}, Output: out}
+	for _, line := range strings.Split(out, "\n") {
+		m := traceHopPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		hop, _ := strconv.Atoi(m[1])
+		result.Hops = append(result.Hops, parseTraceHop(hop, m[2]))
+	}
+	result.Reached = traceReached(result.Hops, targets)
+	return result, nil
+}
+
+// parseTraceHop reads the probes of a traceroute line such as
+// "router (10.0.0.1)  0.345 ms  0.300 ms *"
+func parseTraceHop(number int, line string) TraceHop {
+	hop := TraceHop{Hop: number}
+	var rtts []float64
+	fields := strings.Fields(line)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		switch {
+		case field == "*":
+			hop.Sent++
+		case i+1 < len(fields) && fields[i+1] == "ms":
+			if rtt, err := strconv.ParseFloat(field, 64); err == nil {
+				rtts = append(rtts, rtt)
+				hop.Sent++
+			}
+			i++
+		case strings.HasPrefix(field, "(") && strings.HasSuffix(field, ")"):
+			if hop.Address == "" {
+				hop.Address = strings.Trim(field, "()")
+			}
+		case strings.HasPrefix(field, "!"):
+			// Annotations such as !H for an unreachable host
+		default:
+			// A name followed by its address, or an address without a name
+			if hop.Address == "" && hop.Hostname == "" {
+				if net.ParseIP(field) != nil {
+					hop.Address = field
+				} else {
+					hop.Hostname = field
+				}
+			}
+		}
+	}
+	if hop.Hostname == hop.Address {
+		hop.Hostname = ""
+	}
+
+	if hop.Sent > 0 {
+		hop.Loss = float64(hop.Sent-len(rtts)) / float64(hop.Sent) * 100
+	}
+	if len(rtts) > 0 {
+		hop.Last = rtts[len(rtts)-1]
+		hop.Best, hop.Worst = math.Inf(1), 0
+		var sum float64
+		for _, rtt := range rtts {
+			hop.Best = math.Min(hop.Best, rtt)
+			hop.Worst = math.Max(hop.Worst, rtt)
+			sum += rtt
+		}
+		hop.Avg = sum / float64(len(rtts))
+	}
+	return hop
+}
+
+// mtrHubHostPattern splits an mtr -b host into its name and address
+var mtrHubHostPattern = regexp.MustCompile(`^(\S+) \(([^)]+)\)$`)
+
+// mtrReport runs mtr for the spec's number of cycles
+func mtrReport(ctx context.Context, spec *networkDiagnosticSpec) (*TraceResult, error) {
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("mtr is not supported on %s", runtime.GOOS)
+	}
+	targets, err := resolveTarget(ctx, spec.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := run(ctx, "mtr", "--json", "-b", "-c", strconv.Itoa(spec.Count), "-m", strconv.Itoa(spec.MaxHops), spec.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	var report struct {
+		Report struct {
+			Hubs []struct {
+				// Older mtr versions report the hop number as a string
+				Count json.Number `json:"count"`
+				Host  string      `json:"host"`
+				Loss  float64     `json:"Loss%"`
+				Sent  int         `json:"Snt"`
+				Last  float64     `json:"Last"`
+				Avg   float64     `json:"Avg"`
+				Best  float64     `json:"Best"`
+				Worst float64     `json:"Wrst"`
+			} `json:"hubs"`
+		} `json:"report"`
+	}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		return nil, fmt.Errorf("failed to parse mtr report: %w", err)
+	}
+
+	result := &TraceResult{Hops: []TraceHop{}}
+	for _, hub := range report.Report.Hubs {
+		number, _ := strconv.Atoi(hub.Count.String())
+		hop := TraceHop{Hop: number, Sent: hub.Sent, Loss: hub.Loss, Last: hub.Last, Avg: hub.Avg, Best: hub.Best, Worst: hub.Worst}
+		switch m := mtrHubHostPattern.FindStringSubmatch(hub.Host); {
+		case hub.Host == "???":
+			// No reply
+		case m != nil:
+			hop.Hostname, hop.Address = m[1], m[2]
+		default:
+			hop.Address = hub.Host
+		}
+		result.Hops = append(result.Hops, hop)
+	}
+	result.Reached = traceReached(result.Hops, targets)
+	return result, nil
+}
+
+// resolveTarget returns the addresses of a trace's target
+func resolveTarget(ctx context.Context, target string) ([]string, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]string, len(addrs))
+	for i, addr := range addrs {
+		targets[i] = addr.IP.String()
+	}
+	return targets, nil
+}
+
+// traceReached reports whether the last hop that answered is the target
+func traceReached(hops []TraceHop, targets []string) bool {
+	for i := len(hops) - 1; i >= 0; i-- {
+		if hops[i].Address == "" {
+			continue
+		}
+		for _, target := range targets {
+			if hops[i].Address == target {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// tcpConnect connects to host:port the spec's number of times
+func tcpConnect(ctx context.Context, spec *networkDiagnosticSpec) (*TCPConnectResult, error) {
+	if spec.Port < 1 || spec.Port > 65535 || spec.Count < 1 {
+		return nil, fmt.Errorf("invalid port or count")
+	}
+
+	address := net.JoinHostPort(spec.Target, strconv.Itoa(spec.Port))
+	result := &TCPConnectResult{Attempts: []TCPConnectAttempt{}}
+	for i := 0; i < spec.Count && ctx.Err() == nil; i++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, tcpConnectTimeout)
+		var dialer net.Dialer
+		started := time.Now()
+		conn, err := dialer.DialContext(attemptCtx, "tcp", address)
+		attempt := TCPConnectAttempt{Latency: milliseconds(time.Since(started))}
+		cancel()
+		if err != nil {
+			attempt.Error = err.Error()
+		} else {
+			result.Address = conn.RemoteAddr().String()
+			result.Succeeded++
+			conn.Close()
+		}
+		result.Attempts = append(result.Attempts, attempt)
+	}
+	return result, nil
+}
+
+// bandwidthTest sends to the bandwidth server of a peer's agent for the spec's
+// duration and returns what the server received
+func bandwidthTest(ctx context.Context, spec *networkDiagnosticSpec) (*BandwidthResult, error) {
+	if spec.Port < 1 || spec.Port > 65535 || spec.Duration < 1 || spec.Token == "" {
+		return nil, fmt.Errorf("invalid port, duration or token")
+	}
+
+	address := net.JoinHostPort(spec.Target, strconv.Itoa(spec.Port))
+	dialCtx, cancel := context.WithTimeout(ctx, tcpConnectTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(dialCtx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := io.WriteString(conn, spec.Token); err != nil {
+		return nil, fmt.Errorf("failed to start the test: %w", err)
+	}
+	buf := make([]byte, 128<<10)
+	stop := time.Now().Add(time.Duration(spec.Duration) * time.Second)
+	conn.SetWriteDeadline(stop)
+	for time.Now().Before(stop) {
+		if _, err := conn.Write(buf); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, fmt.Errorf("failed to send: %w", err)
+		}
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+	}
+
+	conn.SetReadDeadline(time.Now().Add(bandwidthReportTimeout))
+	var result BandwidthResult
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to read the server's count: %w", err)
+	}
+	return &result, nil
+}
+
+// bandwidthServer listens for the connection of one bandwidth test and returns
+// the port it listens on. The test runs after the command has answered.
+func bandwidthServer(rawArgs json.RawMessage) (map[string]int, error) {
+	var spec bandwidthServerSpec
+	if err := json.Unmarshal(rawArgs, &spec); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if spec.Port < 0 || spec.Port > 65535 || spec.Duration < 1 || spec.Duration > 60 || spec.Token == "" {
+		return nil, fmt.Errorf("invalid port, duration or token")
+	}
+
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(spec.Port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	go serveBandwidthTest(listener.(*net.TCPListener), &spec)
+	return map[string]int{"port": listener.Addr().(*net.TCPAddr).Port}, nil
+}
+
+// serveBandwidthTest accepts connections until one presents the test's token
+// and runs the test with it, or until the client is too late
+func serveBandwidthTest(listener *net.TCPListener, spec *bandwidthServerSpec) {
+	defer listener.Close()
+	duration := time.Duration(spec.Duration) * time.Second
+	listener.SetDeadline(time.Now().Add(duration + bandwidthAcceptWindow))
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		if receiveBandwidthTest(conn, spec.Token, duration) {
+			return
+		}
+	}
+}
+
+// receiveBandwidthTest counts what a client sends until it stops and answers
+// the count. It reports whether the client presented the token.
+func receiveBandwidthTest(conn net.Conn, token string, duration time.Duration) bool {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(duration + bandwidthReportTimeout + tcpConnectTimeout))
+
+	presented := make([]byte, len(token))
+	if _, err := io.ReadFull(conn, presented); err != nil || subtle.ConstantTimeCompare(presented, []byte(token)) != 1 {
+		return false
+	}
+
+	started := time.Now()
+	received, _ := io.Copy(io.Discard, conn)
+	seconds := time.Since(started).Seconds()
+	result := BandwidthResult{Bytes: received, Seconds: seconds}
+	if seconds > 0 {
+		result.BitsPerSecond = float64(received) * 8 / seconds
+	}
+	json.NewEncoder(conn).Encode(&result)
+	return true
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
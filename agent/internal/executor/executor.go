@@ -0,0 +1,303 @@
+// Package executor runs commands received over the agent command channel
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/wangjialin/myops/agent/internal/plugins"
+	"github.com/wangjialin/myops/agent/internal/reporter"
+)
+
+// Supported command types
+const (
+	CommandProcessList    = "process_list"
+	CommandProcessRenice  = "process_renice"
+	CommandProcessIonice  = "process_ionice"
+	CommandServiceList    = "service_list"
+	CommandServiceControl = "service_control"
+)
+
+// defaultTimeout applies when the server does not set a command timeout
+const defaultTimeout = 30 * time.Second
+
+// serviceNamePattern matches valid systemd unit and Windows service names
+var serviceNamePattern = regexp.MustCompile(`^[a-zA-Z0-9@._:\-]+$`)
+
+// serviceActions lists the service actions the agent accepts, named after the
+// systemctl verbs
+var serviceActions = map[string]bool{
+	"start": true, "stop": true, "restart": true, "status": true, "enable": true, "disable": true,
+}
+
+// ProcessInfo represents a running process as reported to the server
+type ProcessInfo struct {
+	PID         int32     `json:"pid"`
+	Name        string    `json:"name"`
+	Command     string    `json:"command"`
+	User        string    `json:"user"`
+	Status      string    `json:"status"`
+	CPUPercent  float64   `json:"cpuPercent"`
+	MemoryBytes int64     `json:"memoryBytes"`
+	MemoryMB    float64   `json:"memoryMB"`
+	StartTime   time.Time `json:"startTime"`
+	RunTime     string    `json:"runTime"`
+	Terminal    string    `json:"terminal"`
+}
+
+// ServiceInfo represents the state of a service as reported to the server, in
+// systemd's terms on every platform
+type ServiceInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	LoadState   string `json:"loadState,omitempty"`
+	ActiveState string `json:"activeState"`
+	SubState    string `json:"subState,omitempty"`
+	UnitFile    string `json:"unitFileState,omitempty"`
+	MainPID     int32  `json:"mainPid,omitempty"`
+}
+
+// Executor executes server commands on the local host
+type Executor struct {
+	plugins      *plugins.Manager // nil while plugins are disabled
+	updateConfig ConfigUpdater    // nil while remote configuration is disabled
+}
+
+// NewExecutor creates a new executor
+func NewExecutor() *Executor {
+	return &Executor{}
+}
+
+// Execute runs a command and returns its result. Command failures are reported
+// in the result rather than as an error so the server always gets an answer.
+func (e *Executor) Execute(ctx context.Context, cmd reporter.Command) *reporter.CommandResult {
+	if unsupportedCommands[cmd.Type] {
+		return &reporter.CommandResult{ExitCode: 1, Error: fmt.Sprintf("%s is not supported on %s", cmd.Type, runtime.GOOS)}
+	}
+
+	timeout := defaultTimeout
+	if cmd.Timeout > 0 {
+		timeout = time.Duration(cmd.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		output interface{}
+		err    error
+	)
+	switch cmd.Type {
+	case CommandProcessList:
+		output, err = listProcesses(ctx)
+	case CommandProcessRenice:
+		err = renice(ctx, cmd.Args)
+	case CommandProcessIonice:
+		err = ionice(ctx, cmd.Args)
+	case CommandServiceList:
+		output, err = listServices(ctx)
+	case CommandServiceControl:
+		output, err = controlService(ctx, cmd.Args)
+	case CommandCrontabRead:
+		output, err = readCrontab(ctx, cmd.Args)
+	case CommandCrontabWrite:
+		err = writeCrontab(ctx, cmd.Args)
+	case CommandTimerList:
+		output, err = listTimers(ctx)
+	case CommandCalendarPreview:
+		output, err = previewCalendar(ctx, cmd.Args)
+	case CommandOtelApply:
+		output, err = applyCollector(ctx, cmd.Args)
+	case CommandOtelRemove:
+		err = removeCollector(ctx, cmd.Args)
+	case CommandOtelStatus:
+		output, err = getCollectorStatus(ctx, cmd.Args)
+	case CommandComplianceScan:
+		output, err = scanCompliance(ctx, cmd.Args)
+	case CommandPluginSync:
+		output, err = e.syncPlugins(cmd.Args)
+	case CommandConfigUpdate:
+		output, err = e.applyConfigUpdate(cmd.Args)
+	case CommandSyntheticProbe:
+		output, err = syntheticProbe(ctx, cmd.Args)
+	case CommandNetworkDiagnostic:
+		output, err = networkDiagnostic(ctx, cmd.Args)
+	case CommandBandwidthServer:
+		output, err = bandwidthServer(cmd.Args)
+	default:
+		err = fmt.Errorf("unsupported command type: %s", cmd.Type)
+	}
+
+	if err != nil {
+		return &reporter.CommandResult{ExitCode: 1, Error: err.Error()}
+	}
+
+	result := &reporter.CommandResult{}
+	if output != nil {
+		data, err := json.Marshal(output)
+		if err != nil {
+			return &reporter.CommandResult{ExitCode: 1, Error: fmt.Sprintf("failed to encode output: %v", err)}
+		}
+		result.Output = string(data)
+	}
+	return result
+}
+
+// listProcesses returns all running processes, highest CPU usage first
+func listProcesses(ctx context.Context) ([]ProcessInfo, error) {
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	now := time.Now()
+	processes := make([]ProcessInfo, 0, len(procs))
+	for _, p := range procs {
+		name, err := p.NameWithContext(ctx)
+		if err != nil {
+			// Process exited while listing
+			continue
+		}
+
+		info := ProcessInfo{
+			PID:      p.Pid,
+			Name:     name,
+			Status:   "unknown",
+			Terminal: "?",
+		}
+		if cmdline, err := p.CmdlineWithContext(ctx); err == nil && cmdline != "" {
+			info.Command = cmdline
+		} else {
+			info.Command = name
+		}
+		if user, err := p.UsernameWithContext(ctx); err == nil {
+			info.User = user
+		}
+		if status, err := p.StatusWithContext(ctx); err == nil && len(status) > 0 {
+			info.Status = processStatus(status[0])
+		}
+		if cpuPercent, err := p.CPUPercentWithContext(ctx); err == nil {
+			info.CPUPercent = cpuPercent
+		}
+		if mem, err := p.MemoryInfoWithContext(ctx); err == nil {
+			info.MemoryBytes = int64(mem.RSS)
+			info.MemoryMB = float64(mem.RSS) / (1024 * 1024)
+		}
+		if created, err := p.CreateTimeWithContext(ctx); err == nil {
+			info.StartTime = time.UnixMilli(created)
+			info.RunTime = now.Sub(info.StartTime).Truncate(time.Second).String()
+		}
+		if tty, err := p.TerminalWithContext(ctx); err == nil && tty != "" {
+			info.Terminal = tty
+		}
+
+		processes = append(processes, info)
+	}
+
+	sort.Slice(processes, func(i, j int) bool {
+		return processes[i].CPUPercent > processes[j].CPUPercent
+	})
+	return processes, nil
+}
+
+// processStatus maps gopsutil process states to the server's process statuses
+func processStatus(status string) string {
+	switch status {
+	case process.Running:
+		return "running"
+	case process.Sleep, process.Idle, process.Wait, process.Lock:
+		return "sleeping"
+	case process.Stop:
+		return "stopped"
+	case process.Zombie:
+		return "zombie"
+	default:
+		return "unknown"
+	}
+}
+
+// renice changes the CPU scheduling priority of a process
+func renice(ctx context.Context, rawArgs json.RawMessage) error {
+	var args struct {
+		PID      int32 `json:"pid"`
+		Priority int32 `json:"priority"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	if args.PID <= 0 || args.Priority < -20 || args.Priority > 19 {
+		return fmt.Errorf("invalid pid or priority")
+	}
+
+	return setPriority(ctx, args.PID, args.Priority)
+}
+
+// ionice changes the I/O scheduling class and level of a process
+func ionice(ctx context.Context, rawArgs json.RawMessage) error {
+	var args struct {
+		PID   int32 `json:"pid"`
+		Class int32 `json:"class"`
+		Level int32 `json:"level"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	if args.PID <= 0 || args.Class < 1 || args.Class > 3 || args.Level < 0 || args.Level > 7 {
+		return fmt.Errorf("invalid pid, class or level")
+	}
+
+	return setIOPriority(ctx, args.PID, args.Class, args.Level)
+}
+
+// controlService runs a service action and returns the resulting service state
+func controlService(ctx context.Context, rawArgs json.RawMessage) (*ServiceInfo, error) {
+	var args struct {
+		Name   string `json:"name"`
+		Action string `json:"action"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if !serviceNamePattern.MatchString(args.Name) || strings.HasPrefix(args.Name, "-") {
+		return nil, fmt.Errorf("invalid service name: %s", args.Name)
+	}
+	if !serviceActions[args.Action] {
+		return nil, fmt.Errorf("unsupported service action: %s", args.Action)
+	}
+
+	if args.Action != "status" {
+		if err := serviceAction(ctx, args.Name, args.Action); err != nil {
+			return nil, err
+		}
+	}
+
+	return serviceStatus(ctx, args.Name)
+}
+
+// run executes a program and returns its standard output
+func run(ctx context.Context, name string, args ...string) (string, error) {
+	return runWithInput(ctx, "", name, args...)
+}
+
+// runWithInput executes a program with the given standard input and returns its standard output
+func runWithInput(ctx context.Context, input string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if input != "" {
+		cmd.Stdin = strings.NewReader(input)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("%s failed: %s", name, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("%s failed: %w", name, err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,311 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenTelemetry collector command types
+const (
+	CommandOtelApply  = "otel_collector_apply"
+	CommandOtelRemove = "otel_collector_remove"
+	CommandOtelStatus = "otel_collector_status"
+)
+
+// Locations of collector configs and units managed by the agent
+const (
+	otelConfigDir  = "/etc/otelcol"
+	otelUnitDir    = "/etc/systemd/system"
+	otelUnitPrefix = "myops-otelcol-"
+)
+
+// otelBinaries are the collector distributions the agent can run, preferred first
+var otelBinaries = []string{"otelcol-contrib", "otelcol"}
+
+// collectorNamePattern matches collector names that are safe in file and unit names
+var collectorNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// otelUnitTemplate is the systemd unit a collector runs under
+const otelUnitTemplate = `[Unit]
+Description=OpenTelemetry Collector %s (managed by myops-agent)
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart=%s --config=%s
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// CollectorStatus represents the state of a systemd collector as reported to the server
+type CollectorStatus struct {
+	ActiveState string `json:"activeState"`
+	Healthy     bool   `json:"healthy"`
+	ConfigHash  string `json:"configHash,omitempty"`
+	MainPID     int32  `json:"mainPid,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// otelArgs are the arguments of the collector commands
+type otelArgs struct {
+	Name       string `json:"name"`
+	Config     string `json:"config"`
+	ConfigHash string `json:"configHash"`
+	HealthPort int    `json:"healthPort"`
+	Restart    bool   `json:"restart"`
+	Purge      bool   `json:"purge"`
+}
+
+// collectorPaths are the files belonging to one collector
+type collectorPaths struct {
+	config string
+	hash   string
+	unit   string
+	name   string // systemd unit name
+}
+
+// parseOtelArgs decodes and validates collector command arguments
+func parseOtelArgs(rawArgs json.RawMessage) (*otelArgs, *collectorPaths, error) {
+	var args otelArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if !collectorNamePattern.MatchString(args.Name) {
+		return nil, nil, fmt.Errorf("invalid collector name: %s", args.Name)
+	}
+	unit := otelUnitPrefix + args.Name + ".service"
+	return &args, &collectorPaths{
+		config: filepath.Join(otelConfigDir, args.Name+".yaml"),
+		hash:   filepath.Join(otelConfigDir, args.Name+".hash"),
+		unit:   filepath.Join(otelUnitDir, unit),
+		name:   unit,
+	}, nil
+}
+
+// collectorBinary finds an installed collector binary
+func collectorBinary() (string, error) {
+	for _, name := range otelBinaries {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+		if path := filepath.Join("/usr/local/bin", name); isExecutable(path) {
+			return path, nil
+		}
+	}
+	return "", errors.New("no OpenTelemetry collector binary installed (otelcol-contrib or otelcol)")
+}
+
+// isExecutable reports whether path is an executable regular file
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode()&0o111 != 0
+}
+
+// applyCollector installs a collector config and unit. The new config is validated
+// before it replaces the running one, and the previous config is restored if the
+// collector does not come back up after the restart.
+func applyCollector(ctx context.Context, rawArgs json.RawMessage) (*CollectorStatus, error) {
+	args, paths, err := parseOtelArgs(rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	if args.Config == "" {
+		return nil, errors.New("config is required")
+	}
+	binary, err := collectorBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(otelConfigDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	staged := paths.config + ".new"
+	if err := os.WriteFile(staged, []byte(args.Config), 0o640); err != nil {
+		return nil, fmt.Errorf("failed to write config: %w", err)
+	}
+	defer os.Remove(staged)
+
+	if _, err := run(ctx, binary, "validate", "--config="+staged); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
+
+	currentHash, _ := os.ReadFile(paths.hash)
+	_, unitErr := os.Stat(paths.unit)
+	unchanged := args.ConfigHash != "" && strings.TrimSpace(string(currentHash)) == args.ConfigHash && unitErr == nil
+	if unchanged && !args.Restart {
+		if _, err := run(ctx, "systemctl", "start", "--no-pager", "--", paths.name); err != nil {
+			return nil, err
+		}
+		return collectorStatus(ctx, paths, args.HealthPort), nil
+	}
+
+	backup := paths.config + ".bak"
+	previous, readErr := os.ReadFile(paths.config)
+	hasPrevious := readErr == nil
+	if hasPrevious {
+		if err := os.WriteFile(backup, previous, 0o640); err != nil {
+			return nil, fmt.Errorf("failed to back up config: %w", err)
+		}
+	}
+	if err := os.Rename(staged, paths.config); err != nil {
+		return nil, fmt.Errorf("failed to install config: %w", err)
+	}
+
+	unit := fmt.Sprintf(otelUnitTemplate, args.Name, binary, paths.config)
+	if err := os.WriteFile(paths.unit, []byte(unit), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write unit: %w", err)
+	}
+	if _, err := run(ctx, "systemctl", "daemon-reload"); err != nil {
+		return nil, err
+	}
+	if _, err := run(ctx, "systemctl", "enable", "--no-pager", "--", paths.name); err != nil {
+		return nil, err
+	}
+
+	if err := restartCollector(ctx, paths); err != nil {
+		if hasPrevious {
+			_ = os.Rename(backup, paths.config)
+			_ = restartCollector(ctx, paths)
+			return nil, fmt.Errorf("collector failed to start with the new config, previous config restored: %w", err)
+		}
+		return nil, fmt.Errorf("collector failed to start: %w", err)
+	}
+
+	if err := os.WriteFile(paths.hash, []byte(args.ConfigHash), 0o640); err != nil {
+		return nil, fmt.Errorf("failed to record config hash: %w", err)
+	}
+	os.Remove(backup)
+	return collectorStatus(ctx, paths, args.HealthPort), nil
+}
+
+// restartCollector restarts the unit and waits for it to stay active
+func restartCollector(ctx context.Context, paths *collectorPaths) error {
+	if _, err := run(ctx, "systemctl", "restart", "--no-pager", "--", paths.name); err != nil {
+		return err
+	}
+	// A bad config makes the collector exit shortly after starting
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(3 * time.Second):
+	}
+	if _, err := run(ctx, "systemctl", "is-active", "--quiet", "--", paths.name); err != nil {
+		return fmt.Errorf("unit %s is not active", paths.name)
+	}
+	return nil
+}
+
+// removeCollector stops a collector and, when purging, deletes its unit and config
+func removeCollector(ctx context.Context, rawArgs json.RawMessage) error {
+	args, paths, err := parseOtelArgs(rawArgs)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(paths.unit); os.IsNotExist(err) {
+		return nil
+	}
+
+	if _, err := run(ctx, "systemctl", "stop", "--no-pager", "--", paths.name); err != nil {
+		return err
+	}
+	if !args.Purge {
+		return nil
+	}
+
+	if _, err := run(ctx, "systemctl", "disable", "--no-pager", "--", paths.name); err != nil {
+		return err
+	}
+	for _, path := range []string{paths.unit, paths.config, paths.hash} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	_, err = run(ctx, "systemctl", "daemon-reload")
+	return err
+}
+
+// getCollectorStatus reports the unit state, health endpoint and deployed config hash
+func getCollectorStatus(ctx context.Context, rawArgs json.RawMessage) (*CollectorStatus, error) {
+	args, paths, err := parseOtelArgs(rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	return collectorStatus(ctx, paths, args.HealthPort), nil
+}
+
+// collectorStatus gathers the state of an installed collector
+func collectorStatus(ctx context.Context, paths *collectorPaths, healthPort int) *CollectorStatus {
+	status := &CollectorStatus{}
+	if _, err := os.Stat(paths.unit); os.IsNotExist(err) {
+		status.ActiveState = "inactive"
+		return status
+	}
+
+	out, err := run(ctx, "systemctl", "show", "--no-pager", "--property=ActiveState,MainPID", "--", paths.name)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "ActiveState":
+			status.ActiveState = value
+		case "MainPID":
+			if pid, err := strconv.Atoi(value); err == nil {
+				status.MainPID = int32(pid)
+			}
+		}
+	}
+
+	if hash, err := os.ReadFile(paths.hash); err == nil {
+		status.ConfigHash = strings.TrimSpace(string(hash))
+	}
+
+	if status.ActiveState == "active" && healthPort > 0 {
+		if err := checkCollectorHealth(ctx, healthPort); err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Healthy = true
+		}
+	}
+	return status
+}
+
+// checkCollectorHealth queries the collector's health_check extension
+func checkCollectorHealth(ctx context.Context, port int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", port), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+	return nil
+}
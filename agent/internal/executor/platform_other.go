@@ -0,0 +1,51 @@
+//go:build !windows
+
+package executor
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// unsupportedCommands lists the command types this platform cannot run
+var unsupportedCommands map[string]bool
+
+// setPriority renices a process
+func setPriority(ctx context.Context, pid, priority int32) error {
+	_, err := run(ctx, "renice", "-n", strconv.Itoa(int(priority)), "-p", strconv.Itoa(int(pid)))
+	return err
+}
+
+// setIOPriority sets the I/O scheduling class and level of a process with ionice
+func setIOPriority(ctx context.Context, pid, class, level int32) error {
+	args := []string{"-c", strconv.Itoa(int(class))}
+	if class != 3 {
+		// The idle class takes no priority level
+		args = append(args, "-n", strconv.Itoa(int(level)))
+	}
+	args = append(args, "-p", strconv.Itoa(int(pid)))
+
+	_, err := run(ctx, "ionice", args...)
+	return err
+}
+
+// fileOwner returns the names of a file's owner and group, or their IDs when
+// they have no name
+func fileOwner(path string, info os.FileInfo) (string, string) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", ""
+	}
+	owner := strconv.FormatUint(uint64(stat.Uid), 10)
+	if u, err := user.LookupId(owner); err == nil {
+		owner = u.Username
+	}
+	group := strconv.FormatUint(uint64(stat.Gid), 10)
+	if g, err := user.LookupGroupId(group); err == nil {
+		group = g.Name
+	}
+	return owner, group
+}
@@ -0,0 +1,85 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// unsupportedCommands lists the command types this platform cannot run: cron,
+// systemd timers and the systemd-managed OpenTelemetry Collector
+var unsupportedCommands = map[string]bool{
+	CommandCrontabRead:     true,
+	CommandCrontabWrite:    true,
+	CommandTimerList:       true,
+	CommandCalendarPreview: true,
+	CommandOtelApply:       true,
+	CommandOtelRemove:      true,
+	CommandOtelStatus:      true,
+}
+
+// setPriority maps a nice value onto the nearest Windows priority class. The
+// realtime class is never used.
+func setPriority(ctx context.Context, pid, priority int32) error {
+	class := uint32(windows.NORMAL_PRIORITY_CLASS)
+	switch {
+	case priority <= -15:
+		class = windows.HIGH_PRIORITY_CLASS
+	case priority <= -5:
+		class = windows.ABOVE_NORMAL_PRIORITY_CLASS
+	case priority >= 15:
+		class = windows.IDLE_PRIORITY_CLASS
+	case priority >= 5:
+		class = windows.BELOW_NORMAL_PRIORITY_CLASS
+	}
+
+	h, err := windows.OpenProcess(windows.PROCESS_SET_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return fmt.Errorf("failed to open process %d: %w", pid, err)
+	}
+	defer windows.CloseHandle(h)
+
+	if err := windows.SetPriorityClass(h, class); err != nil {
+		return fmt.Errorf("failed to set priority of process %d: %w", pid, err)
+	}
+	return nil
+}
+
+// setIOPriority is not available: Windows has no per-process I/O class that can
+// be set from another process
+func setIOPriority(ctx context.Context, pid, class, level int32) error {
+	return fmt.Errorf("I/O priority is not supported on windows")
+}
+
+// fileOwner returns the account names of a file's owner and primary group, or
+// their SIDs when they cannot be resolved
+func fileOwner(path string, info os.FileInfo) (string, string) {
+	sd, err := windows.GetNamedSecurityInfo(path, windows.SE_FILE_OBJECT,
+		windows.OWNER_SECURITY_INFORMATION|windows.GROUP_SECURITY_INFORMATION)
+	if err != nil {
+		return "", ""
+	}
+
+	var owner, group string
+	if sid, _, err := sd.Owner(); err == nil && sid != nil {
+		owner = accountName(sid)
+	}
+	if sid, _, err := sd.Group(); err == nil && sid != nil {
+		group = accountName(sid)
+	}
+	return owner, group
+}
+
+// accountName resolves a SID to DOMAIN\account, falling back to the SID string
+func accountName(sid *windows.SID) string {
+	account, domain, _, err := sid.LookupAccount("")
+	if err != nil {
+		return sid.String()
+	}
+	if domain == "" {
+		return account
+	}
+	return domain + `\` + account
+}
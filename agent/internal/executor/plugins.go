@@ -0,0 +1,50 @@
+package executor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/wangjialin/myops/agent/internal/plugins"
+)
+
+// CommandPluginSync replaces the set of plugins the agent runs
+const CommandPluginSync = "plugin_sync"
+
+// pluginSyncArgs are the arguments of a plugin_sync command
+type pluginSyncArgs struct {
+	Plugins []plugins.Spec `json:"plugins"`
+	Hash    string         `json:"hash"`
+}
+
+// PluginSyncResult reports the plugins the agent now runs
+type PluginSyncResult struct {
+	Plugins []string `json:"plugins"`
+	Hash    string   `json:"hash"`
+}
+
+// SetPlugins sets the plugin manager plugin_sync commands apply to
+func (e *Executor) SetPlugins(manager *plugins.Manager) {
+	e.plugins = manager
+}
+
+// syncPlugins applies the plugin set pushed by the server
+func (e *Executor) syncPlugins(rawArgs json.RawMessage) (*PluginSyncResult, error) {
+	if e.plugins == nil {
+		return nil, errors.New("plugins are disabled on this agent")
+	}
+
+	var args pluginSyncArgs
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if err := e.plugins.Apply(args.Plugins, args.Hash); err != nil {
+		return nil, err
+	}
+
+	result := &PluginSyncResult{Plugins: make([]string, len(args.Plugins)), Hash: args.Hash}
+	for i, spec := range args.Plugins {
+		result.Plugins[i] = spec.Name
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+//go:build !windows
+
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// listServices returns all systemd services known to the host
+func listServices(ctx context.Context) ([]ServiceInfo, error) {
+	out, err := run(ctx, "systemctl", "list-units", "--type=service", "--all", "--no-legend", "--no-pager", "--plain")
+	if err != nil {
+		return nil, err
+	}
+
+	services := []ServiceInfo{}
+	for _, line := range strings.Split(out, "\n") {
+		// UNIT LOAD ACTIVE SUB DESCRIPTION
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		services = append(services, ServiceInfo{
+			Name:        fields[0],
+			LoadState:   fields[1],
+			ActiveState: fields[2],
+			SubState:    fields[3],
+			Description: strings.Join(fields[4:], " "),
+		})
+	}
+	return services, nil
+}
+
+// serviceAction runs a systemctl verb on a service
+func serviceAction(ctx context.Context, name, action string) error {
+	_, err := run(ctx, "systemctl", action, "--no-pager", "--", name)
+	return err
+}
+
+// serviceStatus reads the state of a service with systemctl show
+func serviceStatus(ctx context.Context, name string) (*ServiceInfo, error) {
+	out, err := run(ctx, "systemctl", "show", "--no-pager",
+		"--property=Id,Description,LoadState,ActiveState,SubState,UnitFileState,MainPID", "--", name)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ServiceInfo{Name: name}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Id":
+			info.Name = value
+		case "Description":
+			info.Description = value
+		case "LoadState":
+			info.LoadState = value
+		case "ActiveState":
+			info.ActiveState = value
+		case "SubState":
+			info.SubState = value
+		case "UnitFileState":
+			info.UnitFile = value
+		case "MainPID":
+			if pid, err := strconv.Atoi(value); err == nil {
+				info.MainPID = int32(pid)
+			}
+		}
+	}
+
+	if info.LoadState == "not-found" {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	return info, nil
+}
@@ -0,0 +1,219 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// servicePollInterval is how often a service is queried while waiting for it to
+// reach a state
+const servicePollInterval = 250 * time.Millisecond
+
+// listServices returns all Win32 services known to the service control manager
+func listServices(ctx context.Context) ([]ServiceInfo, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	names, err := m.ListServices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	services := make([]ServiceInfo, 0, len(names))
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		s, err := m.OpenService(name)
+		if err != nil {
+			// Removed while listing, or not visible to the agent
+			continue
+		}
+		info, err := queryService(s)
+		s.Close()
+		if err != nil {
+			continue
+		}
+		services = append(services, *info)
+	}
+	return services, nil
+}
+
+// serviceAction runs a service action through the service control manager,
+// waiting for start and stop to complete as systemctl does
+func serviceAction(ctx context.Context, name, action string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := openService(m, name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	switch action {
+	case "start":
+		return startService(ctx, s)
+	case "stop":
+		return stopService(ctx, s)
+	case "restart":
+		if err := stopService(ctx, s); err != nil {
+			return err
+		}
+		return startService(ctx, s)
+	case "enable", "disable":
+		cfg, err := s.Config()
+		if err != nil {
+			return fmt.Errorf("failed to read service %s: %w", name, err)
+		}
+		cfg.StartType = mgr.StartAutomatic
+		if action == "disable" {
+			cfg.StartType = mgr.StartDisabled
+		}
+		if err := s.UpdateConfig(cfg); err != nil {
+			return fmt.Errorf("failed to %s service %s: %w", action, name, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported service action: %s", action)
+	}
+}
+
+// serviceStatus reads the state of a service from the service control manager
+func serviceStatus(ctx context.Context, name string) (*ServiceInfo, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := openService(m, name)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	return queryService(s)
+}
+
+// openService opens a service by name, with the error systemctl users expect
+// when it does not exist
+func openService(m *mgr.Mgr, name string) (*mgr.Service, error) {
+	s, err := m.OpenService(name)
+	if errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST) {
+		return nil, fmt.Errorf("service %s not found", name)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open service %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// queryService describes a service in the systemd terms the server uses
+func queryService(s *mgr.Service) (*ServiceInfo, error) {
+	status, err := s.Query()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query service %s: %w", s.Name, err)
+	}
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service %s: %w", s.Name, err)
+	}
+
+	info := &ServiceInfo{
+		Name:        s.Name,
+		Description: cfg.DisplayName,
+		LoadState:   "loaded",
+		MainPID:     int32(status.ProcessId),
+	}
+	switch status.State {
+	case svc.Running:
+		info.ActiveState, info.SubState = "active", "running"
+	case svc.StartPending:
+		info.ActiveState, info.SubState = "activating", "start-pending"
+	case svc.ContinuePending:
+		info.ActiveState, info.SubState = "activating", "continue-pending"
+	case svc.StopPending:
+		info.ActiveState, info.SubState = "deactivating", "stop-pending"
+	case svc.PausePending:
+		info.ActiveState, info.SubState = "deactivating", "pause-pending"
+	case svc.Paused:
+		info.ActiveState, info.SubState = "inactive", "paused"
+	default:
+		info.ActiveState, info.SubState = "inactive", "dead"
+	}
+	switch cfg.StartType {
+	case mgr.StartDisabled:
+		info.UnitFile = "disabled"
+	case mgr.StartManual:
+		info.UnitFile = "manual"
+	default:
+		// Boot, system and automatic start services start with the host
+		info.UnitFile = "enabled"
+	}
+	return info, nil
+}
+
+// startService starts a service unless it is running and waits until it is
+func startService(ctx context.Context, s *mgr.Service) error {
+	status, err := s.Query()
+	if err != nil {
+		return fmt.Errorf("failed to query service %s: %w", s.Name, err)
+	}
+	if status.State != svc.Running && status.State != svc.StartPending {
+		if err := s.Start(); err != nil {
+			return fmt.Errorf("failed to start service %s: %w", s.Name, err)
+		}
+	}
+	return waitService(ctx, s, svc.Running)
+}
+
+// stopService stops a service unless it is stopped and waits until it is
+func stopService(ctx context.Context, s *mgr.Service) error {
+	status, err := s.Query()
+	if err != nil {
+		return fmt.Errorf("failed to query service %s: %w", s.Name, err)
+	}
+	if status.State != svc.Stopped && status.State != svc.StopPending {
+		if _, err := s.Control(svc.Stop); err != nil {
+			return fmt.Errorf("failed to stop service %s: %w", s.Name, err)
+		}
+	}
+	return waitService(ctx, s, svc.Stopped)
+}
+
+// waitService polls a service until it reaches state or ctx is done
+func waitService(ctx context.Context, s *mgr.Service, state svc.State) error {
+	ticker := time.NewTicker(servicePollInterval)
+	defer ticker.Stop()
+
+	for {
+		status, err := s.Query()
+		if err != nil {
+			return fmt.Errorf("failed to query service %s: %w", s.Name, err)
+		}
+		if status.State == state {
+			return nil
+		}
+		// A service that stops while starting has failed
+		if state == svc.Running && status.State == svc.Stopped {
+			return fmt.Errorf("service %s stopped while starting (exit code %d)", s.Name, status.Win32ExitCode)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for service %s", s.Name)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package executor
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+// CommandSyntheticProbe probes an endpoint for a synthetic check
+const CommandSyntheticProbe = "synthetic_probe"
+
+// syntheticBodyLimit is how much of a response body the body regex sees
+const syntheticBodyLimit = 1 << 20
+
+// icmpSequence numbers the echo requests of the agent
+var icmpSequence atomic.Uint32
+
+// syntheticProbeSpec is what the server asks to probe
+type syntheticProbeSpec struct {
+	Type      string `json:"type"` // http, tcp or icmp
+	Target    string `json:"target"`
+	Method    string `json:"method,omitempty"`
+	Timeout   int    `json:"timeout"` // seconds
+	BodyRegex string `json:"bodyRegex,omitempty"`
+}
+
+// SyntheticProbeResult is what a probe measured, as reported to the server.
+// The server makes the assertions on status code and latency.
+type SyntheticProbeResult struct {
+	Latency     int64  `json:"latency"` // milliseconds
+	StatusCode  int    `json:"statusCode,omitempty"`
+	BodyMatched *bool  `json:"bodyMatched,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// syntheticProbe probes an endpoint once. Endpoints that do not answer are
+// reported in the result so the server can tell them from agent failures.
+func syntheticProbe(ctx context.Context, rawArgs json.RawMessage) (*SyntheticProbeResult, error) {
+	var spec syntheticProbeSpec
+	if err := json.Unmarshal(rawArgs, &spec); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if spec.Target == "" || spec.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid target or timeout")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(spec.Timeout)*time.Second)
+	defer cancel()
+
+	started := time.Now()
+	result := &SyntheticProbeResult{}
+	var err error
+	switch spec.Type {
+	case "http":
+		err = probeHTTP(ctx, &spec, result)
+	case "tcp":
+		err = probeTCP(ctx, spec.Target)
+	case "icmp":
+		err = probeICMP(ctx, spec.Target)
+	default:
+		return nil, fmt.Errorf("unknown check type: %s", spec.Type)
+	}
+	result.Latency = time.Since(started).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, nil
+}
+
+// probeHTTP requests the target without following redirects and matches the
+// start of the body against the spec's regex
+func probeHTTP(ctx context.Context, spec *syntheticProbeSpec, result *SyntheticProbeResult) error {
+	method := spec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, spec.Target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "myops-synthetic/1.0")
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS12},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, syntheticBodyLimit))
+	if err != nil {
+		return fmt.Errorf("failed to read body: %w", err)
+	}
+	if spec.BodyRegex != "" {
+		re, err := regexp.Compile(spec.BodyRegex)
+		if err != nil {
+			return fmt.Errorf("invalid body regex: %w", err)
+		}
+		matched := re.Match(body)
+		result.BodyMatched = &matched
+	}
+	return nil
+}
+
+// probeTCP opens a connection to host:port
+func probeTCP(ctx context.Context, target string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeICMP sends an echo request and waits for its reply. It needs a raw
+// socket, so the agent must run as root or with CAP_NET_RAW.
+func probeICMP(ctx context.Context, target string) error {
+	addr, err := net.DefaultResolver.LookupIPAddr(ctx, target)
+	if err != nil {
+		return err
+	}
+	if len(addr) == 0 {
+		return fmt.Errorf("no address for %s", target)
+	}
+	ip := addr[0].IP
+
+	network, request, reply := "ip4:icmp", byte(8), byte(0)
+	if ip.To4() == nil {
+		network, request, reply = "ip6:ipv6-icmp", 128, 129
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, ip.String())
+	if err != nil {
+		return fmt.Errorf("failed to open icmp socket: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	id := uint16(os.Getpid())
+	seq := uint16(icmpSequence.Add(1))
+	msg := make([]byte, 16)
+	msg[0] = request
+	binary.BigEndian.PutUint16(msg[4:], id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	copy(msg[8:], "myops-sm")
+	if request == 8 {
+		// The kernel computes ICMPv6 checksums
+		binary.BigEndian.PutUint16(msg[2:], icmpChecksum(msg))
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return fmt.Errorf("failed to send echo request: %w", err)
+	}
+
+	ipConn := conn.(*net.IPConn)
+	buf := make([]byte, 1500)
+	for {
+		// ReadFrom strips the IPv4 header
+		n, _, err := ipConn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return fmt.Errorf("no echo reply from %s", ip)
+			}
+			return err
+		}
+		if n >= 8 && buf[0] == reply && binary.BigEndian.Uint16(buf[4:]) == id && binary.BigEndian.Uint16(buf[6:]) == seq {
+			return nil
+		}
+	}
+}
+
+// icmpChecksum is the internet checksum of an ICMPv4 message
+func icmpChecksum(msg []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(msg); i += 2 {
+		sum += uint32(msg[i])<<8 | uint32(msg[i+1])
+	}
+	if len(msg)%2 == 1 {
+		sum += uint32(msg[len(msg)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
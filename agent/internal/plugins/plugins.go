@@ -0,0 +1,248 @@
+// Package plugins runs custom collectors: executables in the plugin directory that
+// print JSON on a schedule. The server pushes the set of plugins to run, and their
+// latest output is reported with the host under each plugin's name.
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Plugin limits, matching what the server accepts
+const (
+	minInterval = 10 // seconds
+	maxTimeout  = 300
+)
+
+var (
+	// namePattern matches plugin names, which namespace the reported data
+	namePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9_-]{0,61}[a-z0-9])?$`)
+	// commandPattern matches executable names in the plugin directory
+	commandPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,254}$`)
+)
+
+// Spec is a plugin as the server configures it
+type Spec struct {
+	Name     string            `json:"name"`
+	Command  string            `json:"command"` // executable in the plugin directory
+	Args     []string          `json:"args,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	Interval int               `json:"interval"` // seconds
+	Timeout  int               `json:"timeout"`  // seconds
+}
+
+// Result is the latest run of a plugin
+type Result struct {
+	Data        json.RawMessage `json:"data,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	CollectedAt time.Time       `json:"collectedAt"`
+}
+
+// state is the plugin set persisted across restarts
+type state struct {
+	Plugins []Spec `json:"plugins"`
+	Hash    string `json:"hash"`
+}
+
+// Manager runs the configured plugins, each on its own schedule
+type Manager struct {
+	dir       string // plugins are only run from here
+	statePath string
+	user      string // unprivileged user plugins run as, if set
+
+	mu     sync.Mutex
+	specs  []Spec
+	hash   string // the server's hash of specs, reported back to it
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	resultsMu sync.Mutex
+	results   map[string]Result
+}
+
+// NewManager creates a manager running plugins from dir, optionally as user,
+// and keeping the server-pushed plugin set in statePath
+func NewManager(dir, statePath, user string) *Manager {
+	return &Manager{
+		dir:       dir,
+		statePath: statePath,
+		user:      user,
+		results:   make(map[string]Result),
+	}
+}
+
+// Load reads the plugin set persisted by the last Apply. A missing file leaves
+// the set empty until the server pushes one.
+func (m *Manager) Load() error {
+	data, err := os.ReadFile(m.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read plugin state: %w", err)
+	}
+
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("failed to parse plugin state: %w", err)
+	}
+	for i := range st.Plugins {
+		if err := m.validate(&st.Plugins[i]); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	m.specs, m.hash = st.Plugins, st.Hash
+	m.mu.Unlock()
+	return nil
+}
+
+// Start runs the plugins until ctx is done
+func (m *Manager) Start(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ctx = ctx
+	m.restart()
+}
+
+// Apply replaces the plugin set with the one pushed by the server, persisting it
+// so it survives restarts. The set is refused as a whole if any plugin is invalid.
+func (m *Manager) Apply(specs []Spec, hash string) error {
+	names := make(map[string]bool, len(specs))
+	for i := range specs {
+		if err := m.validate(&specs[i]); err != nil {
+			return err
+		}
+		if names[specs[i].Name] {
+			return fmt.Errorf("duplicate plugin %q", specs[i].Name)
+		}
+		names[specs[i].Name] = true
+	}
+
+	data, err := json.Marshal(state{Plugins: specs, Hash: hash})
+	if err != nil {
+		return fmt.Errorf("failed to encode plugin state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(m.statePath), 0o700); err != nil {
+		return fmt.Errorf("failed to save plugin state: %w", err)
+	}
+	tmp := m.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save plugin state: %w", err)
+	}
+	if err := os.Rename(tmp, m.statePath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save plugin state: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.specs, m.hash = specs, hash
+	m.restart()
+
+	m.resultsMu.Lock()
+	for name := range m.results {
+		if !names[name] {
+			delete(m.results, name)
+		}
+	}
+	m.resultsMu.Unlock()
+	slog.Info("applied plugins", "count", len(specs))
+	return nil
+}
+
+// Hash returns the server's hash of the plugin set being run
+func (m *Manager) Hash() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hash
+}
+
+// Results returns the latest result of each plugin that has run, by name
+func (m *Manager) Results() map[string]Result {
+	m.resultsMu.Lock()
+	defer m.resultsMu.Unlock()
+
+	if len(m.results) == 0 {
+		return nil
+	}
+	results := make(map[string]Result, len(m.results))
+	for name, result := range m.results {
+		results[name] = result
+	}
+	return results
+}
+
+// restart stops the running schedules and starts one per plugin; m.mu must be held
+func (m *Manager) restart() {
+	if m.cancel != nil {
+		m.cancel()
+		m.wg.Wait()
+		m.cancel = nil
+	}
+	if m.ctx == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.cancel = cancel
+	for _, spec := range m.specs {
+		m.wg.Add(1)
+		go m.schedule(ctx, spec)
+	}
+}
+
+// schedule runs a plugin at once and then every interval until ctx is done
+func (m *Manager) schedule(ctx context.Context, spec Spec) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(spec.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		result := m.run(ctx, spec)
+		if ctx.Err() != nil {
+			return
+		}
+		m.resultsMu.Lock()
+		m.results[spec.Name] = result
+		m.resultsMu.Unlock()
+		if result.Error != "" {
+			slog.Warn("plugin failed", "plugin", spec.Name, "error", result.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// validate checks a plugin; whether its executable may run is only checked when
+// it runs, so a plugin not installed on this host reports an error instead of
+// holding back the others
+func (m *Manager) validate(spec *Spec) error {
+	if !namePattern.MatchString(spec.Name) {
+		return fmt.Errorf("invalid plugin name %q", spec.Name)
+	}
+	if !commandPattern.MatchString(spec.Command) || spec.Command == "." || spec.Command == ".." {
+		return fmt.Errorf("plugin %s: command must be an executable in %s", spec.Name, m.dir)
+	}
+	if spec.Interval < minInterval {
+		return fmt.Errorf("plugin %s: interval must be at least %d seconds", spec.Name, minInterval)
+	}
+	if spec.Timeout < 1 || spec.Timeout > maxTimeout || spec.Timeout > spec.Interval {
+		return fmt.Errorf("plugin %s: timeout must be between 1 and %d seconds and within the interval", spec.Name, maxTimeout)
+	}
+	return nil
+}
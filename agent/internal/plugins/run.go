@@ -0,0 +1,114 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// maxOutput bounds the JSON a plugin may print per run
+	maxOutput = 1 << 20
+	// maxStderr bounds the stderr kept to explain a failed run
+	maxStderr = 4 << 10
+	// killDelay is how long a timed-out plugin's output pipes are waited for
+	// after its processes are killed
+	killDelay = 2 * time.Second
+)
+
+// errOutputTooLarge is returned when a plugin prints more than maxOutput
+var errOutputTooLarge = fmt.Errorf("output exceeds %d bytes", maxOutput)
+
+// run runs a plugin once, killing it and everything it started when it times out
+func (m *Manager) run(ctx context.Context, spec Spec) Result {
+	result := Result{CollectedAt: time.Now().UTC()}
+
+	path := filepath.Join(m.dir, spec.Command)
+	if err := checkExecutable(path); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(spec.Timeout)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, spec.Args...)
+	cmd.Dir = m.dir
+	// The agent's own environment, which holds its token, is not passed on
+	cmd.Env = append(baseEnv(), "MYOPS_PLUGIN_NAME="+spec.Name)
+	for name, value := range spec.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+	cmd.WaitDelay = killDelay
+	stdout := &limitedBuffer{limit: maxOutput}
+	stderr := &limitedBuffer{limit: maxStderr, truncate: true}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := sandbox(cmd, m.user); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	err := cmd.Run()
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.Error = fmt.Sprintf("timed out after %ds", spec.Timeout)
+	case stdout.overflow:
+		result.Error = errOutputTooLarge.Error()
+	case err != nil:
+		result.Error = err.Error()
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			result.Error += ": " + msg
+		}
+	default:
+		data := bytes.TrimSpace(stdout.Bytes())
+		if !json.Valid(data) {
+			result.Error = "plugin printed invalid JSON"
+		} else {
+			result.Data = json.RawMessage(data)
+		}
+	}
+	return result
+}
+
+// checkExecutable refuses plugin files that are not regular executables or that
+// users other than their owner could change
+func checkExecutable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	return checkMode(path, info)
+}
+
+// limitedBuffer keeps up to limit bytes. Writes beyond it fail, stopping the
+// plugin, unless truncate is set.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int
+	truncate bool
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.overflow = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		if !b.truncate {
+			return 0, errOutputTooLarge
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,39 @@
+//go:build !unix
+
+package plugins
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// baseEnv returns the environment every plugin starts from. Windows programs
+// need SystemRoot to load, so it is passed on with a PATH limited to the system
+// directories.
+func baseEnv() []string {
+	root := os.Getenv("SystemRoot")
+	if root == "" {
+		return nil
+	}
+	system := filepath.Join(root, "System32")
+	return []string{
+		"SystemRoot=" + root,
+		"PATH=" + system + ";" + root + ";" + filepath.Join(system, "WindowsPowerShell", "v1.0"),
+	}
+}
+
+// sandbox has no process groups or user switching to offer here; a timeout
+// kills the plugin process itself
+func sandbox(cmd *exec.Cmd, username string) error {
+	if username != "" {
+		return fmt.Errorf("running plugins as another user is not supported on this platform")
+	}
+	return nil
+}
+
+// checkMode accepts any regular file; permissions are left to the file system ACLs
+func checkMode(path string, info os.FileInfo) error {
+	return nil
+}
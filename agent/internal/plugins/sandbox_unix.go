@@ -0,0 +1,59 @@
+//go:build unix
+
+package plugins
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// pluginPath is the only PATH plugins see
+const pluginPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// baseEnv returns the environment every plugin starts from
+func baseEnv() []string {
+	return []string{"PATH=" + pluginPath}
+}
+
+// sandbox runs the plugin in its own process group, so a timeout kills whatever it
+// started too, and as username when set
+func sandbox(cmd *exec.Cmd, username string) error {
+	attr := &syscall.SysProcAttr{Setpgid: true}
+	if username != "" {
+		u, err := user.Lookup(username)
+		if err != nil {
+			return fmt.Errorf("plugin user: %w", err)
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return fmt.Errorf("plugin user: invalid uid %q", u.Uid)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return fmt.Errorf("plugin user: invalid gid %q", u.Gid)
+		}
+		attr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+		cmd.Env = append(cmd.Env, "HOME="+u.HomeDir, "USER="+u.Username)
+	}
+	cmd.SysProcAttr = attr
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return nil
+}
+
+// checkMode refuses files that are not executable or that group or others may write
+func checkMode(path string, info os.FileInfo) error {
+	mode := info.Mode().Perm()
+	if mode&0o111 == 0 {
+		return fmt.Errorf("%s is not executable", path)
+	}
+	if mode&0o022 != 0 {
+		return fmt.Errorf("%s is writable by group or others", path)
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package reporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// retryBaseDelay is the wait after the first failed flush; it doubles with
+	// every further failure up to retryMaxDelay
+	retryBaseDelay = 5 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+	// bufferCheckInterval is how often Run looks for reports left in the buffer
+	bufferCheckInterval = time.Minute
+)
+
+// ErrReportBuffered is returned when a report could not be sent and was buffered
+// to be resent later
+var ErrReportBuffered = errors.New("report buffered")
+
+// EnableBuffer makes the reporter keep the HTTP reports the server does not take
+// in dir, dropping the oldest beyond maxBytes, and resend them in batches of up
+// to batchSize. Run must be started for reports to be resent between reports.
+func (r *Reporter) EnableBuffer(dir string, maxBytes int64, batchSize int) error {
+	queue, err := openReportQueue(dir, maxBytes)
+	if err != nil {
+		return err
+	}
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	r.queue, r.batchSize = queue, batchSize
+	return nil
+}
+
+// SetCompression sets how HTTP report bodies are compressed: gzip, zstd or none
+func (r *Reporter) SetCompression(compression string) error {
+	switch compression {
+	case "gzip", "zstd":
+		r.compression = compression
+	case "", "none":
+		r.compression = ""
+	default:
+		return fmt.Errorf("unsupported compression %q", compression)
+	}
+	return nil
+}
+
+// Run resends buffered reports as their backoff expires, until ctx is done
+func (r *Reporter) Run(ctx context.Context) {
+	if r.queue == nil {
+		return
+	}
+
+	for {
+		timer := time.NewTimer(r.retryDelay())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-r.retry:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+
+		if r.queue.len() == 0 {
+			continue
+		}
+		if err := r.Flush(); err != nil {
+			slog.Warn("resending buffered reports failed", "error", err)
+		}
+	}
+}
+
+// Flush sends the buffered reports, oldest first, unless a failed attempt's
+// backoff has not expired yet
+func (r *Reporter) Flush() error {
+	if r.queue == nil {
+		return nil
+	}
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	if wait := time.Until(r.retryAt); wait > 0 {
+		return fmt.Errorf("%w, retrying in %s", ErrReportBuffered, wait.Round(time.Second))
+	}
+
+	for {
+		batch, err := r.queue.peek(r.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := r.sendBatch(batch); err != nil {
+			var rejected *batchRejectedError
+			if errors.As(err, &rejected) {
+				// Resending a batch the server refuses would block the buffer forever
+				slog.Error("dropping buffered reports", "count", len(batch), "error", err)
+				r.queue.remove(batch)
+				continue
+			}
+
+			r.failures++
+			r.retryAt = time.Now().Add(backoff(r.failures))
+			r.retryNow()
+			return fmt.Errorf("%w: %v", ErrReportBuffered, err)
+		}
+
+		r.queue.remove(batch)
+		r.failures, r.retryAt = 0, time.Time{}
+	}
+}
+
+// buffer adds a report to the buffer, stamped with the time it was collected
+func (r *Reporter) buffer(data []byte) error {
+	var report map[string]json.RawMessage
+	if err := json.Unmarshal(data, &report); err != nil {
+		return fmt.Errorf("failed to buffer report: %w", err)
+	}
+	collectedAt, _ := json.Marshal(time.Now().UTC())
+	report["collectedAt"] = collectedAt
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to buffer report: %w", err)
+	}
+	return r.queue.push(data)
+}
+
+// batchRejectedError is a batch the server refused for good, such as an invalid
+// report or a rejected host
+type batchRejectedError struct {
+	status int
+	body   string
+}
+
+func (e *batchRejectedError) Error() string {
+	return fmt.Sprintf("server returned status %d: %s", e.status, e.body)
+}
+
+// sendBatch posts buffered reports in one request
+func (r *Reporter) sendBatch(batch []queuedReport) error {
+	reports := make([]json.RawMessage, len(batch))
+	for i, report := range batch {
+		reports[i] = report.data
+	}
+	data, err := json.Marshal(map[string][]json.RawMessage{"reports": reports})
+	if err != nil {
+		return fmt.Errorf("failed to marshal reports: %w", err)
+	}
+	body, encoding, err := r.encode(data)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v1/agent/reports", r.endpoint), body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	r.setHeaders(req)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send reports: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		// Client errors other than timeouts and rate limits will not pass on retry
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return &batchRejectedError{status: resp.StatusCode, body: string(respBody)}
+		}
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var reportResp ReportResponse
+	if err := json.NewDecoder(resp.Body).Decode(&reportResp); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	r.mu.Lock()
+	r.hostID = reportResp.Data.HostID
+	r.mu.Unlock()
+	return nil
+}
+
+// encode compresses a request body with the configured compression and returns
+// it with its Content-Encoding, which is empty for an uncompressed body
+func (r *Reporter) encode(data []byte) (io.Reader, string, error) {
+	var buf bytes.Buffer
+	switch r.compression {
+	case "gzip":
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(data); err != nil {
+			return nil, "", fmt.Errorf("failed to compress report: %w", err)
+		}
+		if err := gz.Close(); err != nil {
+			return nil, "", fmt.Errorf("failed to compress report: %w", err)
+		}
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to compress report: %w", err)
+		}
+		if _, err := zw.Write(data); err != nil {
+			return nil, "", fmt.Errorf("failed to compress report: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, "", fmt.Errorf("failed to compress report: %w", err)
+		}
+	default:
+		return bytes.NewReader(data), "", nil
+	}
+	return &buf, r.compression, nil
+}
+
+// retryDelay returns how long Run waits before its next flush
+func (r *Reporter) retryDelay() time.Duration {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	if r.failures == 0 {
+		return bufferCheckInterval
+	}
+	if wait := time.Until(r.retryAt); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// retryNow wakes Run to reconsider when to flush
+func (r *Reporter) retryNow() {
+	select {
+	case r.retry <- struct{}{}:
+	default:
+	}
+}
+
+// backoff returns the delay after the given number of failed flushes in a row:
+// exponential, capped at retryMaxDelay, with up to half of it as random jitter so
+// a fleet of agents does not retry in lockstep after an outage
+func backoff(failures int) time.Duration {
+	delay := retryMaxDelay
+	if failures < 16 {
+		if d := retryBaseDelay << (failures - 1); d < retryMaxDelay {
+			delay = d
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
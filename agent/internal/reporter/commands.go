@@ -0,0 +1,103 @@
+package reporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Command represents a command queued for this agent by the server
+type Command struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Args      json.RawMessage `json:"args"`
+	Timeout   int32           `json:"timeout"`             // seconds
+	RequestID string          `json:"requestId,omitempty"` // correlation ID of the request that queued the command
+}
+
+// CommandResult represents the result of a command sent back to the server
+type CommandResult struct {
+	HostID   string `json:"hostId"`
+	ExitCode int32  `json:"exitCode"`
+	Output   string `json:"output"`
+	Error    string `json:"error,omitempty"`
+}
+
+// FetchCommands retrieves the pending commands for this host
+func (r *Reporter) FetchCommands() ([]Command, error) {
+	hostID := r.HostID()
+	if hostID == "" {
+		return nil, nil
+	}
+
+	commandsURL := fmt.Sprintf("%s/api/v1/agent/commands?hostId=%s", r.endpoint, url.QueryEscape(hostID))
+	req, err := http.NewRequest("GET", commandsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	r.setHeaders(req)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch commands: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var commandsResp struct {
+		Data []Command `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&commandsResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return commandsResp.Data, nil
+}
+
+// SubmitResult sends the result of a command to the server, under the
+// correlation ID of the request that queued it
+func (r *Reporter) SubmitResult(cmd Command, result *CommandResult) error {
+	result.HostID = r.HostID()
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	resultURL := fmt.Sprintf("%s/api/v1/agent/commands/%s/result", r.endpoint, url.PathEscape(cmd.ID))
+	req, err := http.NewRequest("POST", resultURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cmd.RequestID != "" {
+		req.Header.Set("X-Request-ID", cmd.RequestID)
+	}
+	r.setHeaders(req)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send result: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// setHeaders sets the authentication headers shared by all agent requests
+func (r *Reporter) setHeaders(req *http.Request) {
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.token))
+	req.Header.Set("User-Agent", "MyOps-Agent/1.0")
+}
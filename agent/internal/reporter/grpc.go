@@ -0,0 +1,330 @@
+package reporter
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/wangjialin/myops/agent/internal/collector"
+	agentpb "github.com/wangjialin/myops/pkg/proto/agent"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// grpcRetryInterval is how long the reporter uses HTTP after the gRPC service
+	// could not be reached
+	grpcRetryInterval = 5 * time.Minute
+	// grpcCallTimeout bounds each report and heartbeat sent over gRPC
+	grpcCallTimeout = 30 * time.Second
+)
+
+// ErrGRPCUnavailable is returned by the gRPC-only calls while the reporter uses HTTP
+var ErrGRPCUnavailable = errors.New("gRPC agent service unavailable")
+
+// grpcChannel is the connection to the gateway's gRPC agent service. Reports are
+// sent on one long-lived stream, reopened when it breaks.
+type grpcChannel struct {
+	conn   *grpc.ClientConn
+	client agentpb.AgentServiceClient
+	token  string
+
+	mu        sync.Mutex
+	reports   agentpb.AgentService_StreamReportsClient
+	cancel    context.CancelFunc
+	downUntil time.Time // HTTP is used until then
+}
+
+// EnableGRPC makes the reporter report and take commands over the gRPC agent
+// service at endpoint (host:port), falling back to HTTP while it is unavailable.
+// TLS is verified unless the reporter is insecure.
+func (r *Reporter) EnableGRPC(endpoint string) error {
+	tlsConfig := &tls.Config{InsecureSkipVerify: r.insecure}
+	conn, err := grpc.NewClient(endpoint,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: time.Minute, Timeout: 20 * time.Second, PermitWithoutStream: true}),
+		grpc.WithUserAgent("MyOps-Agent/1.0"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+
+	r.rpc = &grpcChannel{
+		conn:   conn,
+		client: agentpb.NewAgentServiceClient(conn),
+		token:  r.token,
+	}
+	return nil
+}
+
+// GRPCAvailable reports whether calls currently go to the gRPC agent service
+func (r *Reporter) GRPCAvailable() bool {
+	return r.rpc != nil && r.rpc.available()
+}
+
+// Close closes the gRPC connection, if any
+func (r *Reporter) Close() error {
+	if r.rpc == nil {
+		return nil
+	}
+	r.rpc.mu.Lock()
+	r.rpc.closeReports()
+	r.rpc.mu.Unlock()
+	return r.rpc.conn.Close()
+}
+
+// Heartbeat tells the server the host is alive between reports. It needs the gRPC
+// service and returns ErrGRPCUnavailable while the reporter uses HTTP.
+func (r *Reporter) Heartbeat() error {
+	hostID := r.HostID()
+	if hostID == "" || !r.GRPCAvailable() {
+		return ErrGRPCUnavailable
+	}
+
+	ctx, cancel := r.rpc.callContext(context.Background())
+	defer cancel()
+	if _, err := r.rpc.client.Heartbeat(ctx, &agentpb.HeartbeatRequest{HostId: hostID}); err != nil {
+		r.rpc.failed(err)
+		return fmt.Errorf("failed to send heartbeat: %w", err)
+	}
+	return nil
+}
+
+// RunCommandChannel receives the host's commands from the gRPC service as they are
+// queued, runs each with execute and sends back its result. It returns when the
+// channel breaks or ctx is done, and returns ErrGRPCUnavailable at once while the
+// reporter uses HTTP; the caller then polls over HTTP.
+func (r *Reporter) RunCommandChannel(ctx context.Context, execute func(context.Context, Command) *CommandResult) error {
+	hostID := r.HostID()
+	if hostID == "" || !r.GRPCAvailable() {
+		return ErrGRPCUnavailable
+	}
+
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+r.token))
+	defer cancel()
+
+	stream, err := r.rpc.client.CommandChannel(ctx)
+	if err != nil {
+		r.rpc.failed(err)
+		return fmt.Errorf("failed to open command channel: %w", err)
+	}
+	hello := &agentpb.AgentMessage{Message: &agentpb.AgentMessage_Hello{Hello: &agentpb.CommandChannelHello{HostId: hostID}}}
+	if err := stream.Send(hello); err != nil {
+		_, err = stream.Recv()
+		r.rpc.failed(err)
+		return fmt.Errorf("failed to open command channel: %w", err)
+	}
+
+	for {
+		cmd, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return ctx.Err()
+			}
+			// An open channel closes when its gateway shuts down, so reconnect
+			// rather than switching to HTTP
+			return fmt.Errorf("command channel closed: %w", err)
+		}
+
+		command := Command{
+			ID:        cmd.Id,
+			Type:      cmd.Type,
+			Args:      json.RawMessage(cmd.Args),
+			Timeout:   cmd.Timeout,
+			RequestID: cmd.RequestId,
+		}
+		slog.Info("executing command", "command_id", command.ID, "type", command.Type, "request_id", command.RequestID)
+		result := execute(ctx, command)
+		err = stream.Send(&agentpb.AgentMessage{Message: &agentpb.AgentMessage_Result{Result: &agentpb.CommandResult{
+			CommandId: cmd.Id,
+			ExitCode:  result.ExitCode,
+			Output:    result.Output,
+			Error:     result.Error,
+		}}})
+		if err != nil {
+			// The stream is gone; the result still reaches the server over HTTP
+			if submitErr := r.SubmitResult(command, result); submitErr != nil {
+				slog.Error("failed to submit command result", "command_id", command.ID, "request_id", command.RequestID, "error", submitErr)
+			}
+			return fmt.Errorf("command channel closed: %w", err)
+		}
+	}
+}
+
+// reportGRPC sends a report over gRPC, registering the host with the first one.
+// It reports whether the report was sent, so the caller falls back to HTTP otherwise.
+func (r *Reporter) reportGRPC(hostInfo *collector.HostInfo) (bool, error) {
+	if !r.GRPCAvailable() {
+		return false, nil
+	}
+	report := hostReport(hostInfo)
+
+	var ack *agentpb.ReportAck
+	var err error
+	if r.HostID() == "" {
+		ctx, cancel := r.rpc.callContext(context.Background())
+		ack, err = r.rpc.client.Register(ctx, report)
+		cancel()
+	} else {
+		ack, err = r.rpc.streamReport(report)
+	}
+	if err != nil {
+		if r.rpc.failed(err) {
+			slog.Warn("gRPC agent service unavailable, reporting over HTTP", "error", err)
+			return false, nil
+		}
+		return true, fmt.Errorf("failed to send report: %w", err)
+	}
+
+	r.mu.Lock()
+	r.hostID = ack.HostId
+	r.mu.Unlock()
+	return true, nil
+}
+
+func (g *grpcChannel) available() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return time.Now().After(g.downUntil)
+}
+
+// failed switches to HTTP for grpcRetryInterval when err shows the service cannot
+// be reached or does not exist, and reports whether it did
+func (g *grpcChannel) failed(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Unimplemented, codes.DeadlineExceeded:
+	default:
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.downUntil = time.Now().Add(grpcRetryInterval)
+	g.closeReports()
+	return true
+}
+
+func (g *grpcChannel) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+g.token)
+	return context.WithTimeout(ctx, grpcCallTimeout)
+}
+
+// streamReport sends a report on the report stream and waits for its
+// acknowledgement. A broken stream is dropped and reopened by the next report.
+func (g *grpcChannel) streamReport(report *agentpb.HostReport) (*agentpb.ReportAck, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.reports == nil {
+		ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+g.token))
+		stream, err := g.client.StreamReports(ctx)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		g.reports, g.cancel = stream, cancel
+	}
+
+	// A stalled stream must not hang the reporter
+	timer := time.AfterFunc(grpcCallTimeout, g.cancel)
+	defer timer.Stop()
+
+	if err := g.reports.Send(report); err != nil {
+		// Send only reports io.EOF; the stream's status comes from Recv
+		_, err = g.reports.Recv()
+		g.closeReports()
+		return nil, err
+	}
+	ack, err := g.reports.Recv()
+	if err != nil {
+		g.closeReports()
+		return nil, err
+	}
+	return ack, nil
+}
+
+// closeReports ends the report stream; g.mu must be held
+func (g *grpcChannel) closeReports() {
+	if g.cancel != nil {
+		g.cancel()
+	}
+	g.reports, g.cancel = nil, nil
+}
+
+// hostReport converts collected host information to its protobuf form
+func hostReport(info *collector.HostInfo) *agentpb.HostReport {
+	report := &agentpb.HostReport{
+		Hostname:      info.Hostname,
+		IpAddress:     info.IPAddress,
+		MacAddress:    info.MACAddress,
+		Gateway:       info.Gateway,
+		OsType:        info.OSType,
+		OsVersion:     info.OSVersion,
+		KernelVersion: info.KernelVersion,
+		Arch:          info.Arch,
+		CpuModel:      info.CPUModel,
+		CpuCores:      info.CPUCores,
+		MemoryTotal:   info.MemoryTotal,
+		PluginHash:    info.PluginHash,
+	}
+	if len(info.Plugins) > 0 {
+		report.Plugins = make(map[string]*agentpb.PluginOutput, len(info.Plugins))
+		for name, result := range info.Plugins {
+			report.Plugins[name] = &agentpb.PluginOutput{
+				Data:        string(result.Data),
+				Error:       result.Error,
+				CollectedAt: result.CollectedAt.UnixMilli(),
+			}
+		}
+	}
+	for _, disk := range info.Disks {
+		report.Disks = append(report.Disks, &agentpb.Disk{
+			Device:     disk.Device,
+			MountPoint: disk.MountPoint,
+			FileSystem: disk.FileSystem,
+			Total:      disk.Total,
+			Used:       disk.Used,
+			Free:       disk.Free,
+		})
+	}
+	for _, network := range info.Networks {
+		report.Networks = append(report.Networks, &agentpb.NetworkInterface{
+			Name:         network.Name,
+			Addresses:    network.Addresses,
+			HardwareAddr: network.HardwareAddr,
+			Flags:        network.Flags,
+		})
+	}
+	if m := info.Metrics; m != nil {
+		report.Metrics = &agentpb.HostMetrics{
+			CpuUsagePercent: m.CPUUsagePercent,
+			Load1:           m.Load1,
+			Load5:           m.Load5,
+			Load15:          m.Load15,
+			MemoryUsed:      m.MemoryUsed,
+			MemoryAvailable: m.MemoryAvailable,
+			SwapUsed:        m.SwapUsed,
+			UptimeSeconds:   m.UptimeSeconds,
+		}
+		for _, counter := range m.Networks {
+			report.Metrics.Networks = append(report.Metrics.Networks, &agentpb.NetworkCounter{
+				Name:      counter.Name,
+				BytesSent: counter.BytesSent,
+				BytesRecv: counter.BytesRecv,
+			})
+		}
+	}
+	return report
+}
@@ -0,0 +1,156 @@
+package reporter
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reportQueue buffers reports on disk, one file per report. Files are named by the
+// time they were queued so listing the directory yields the oldest first.
+type reportQueue struct {
+	dir      string
+	maxBytes int64
+
+	mu  sync.Mutex
+	seq int
+}
+
+// queuedReport is a report read back from the queue
+type queuedReport struct {
+	name string
+	data []byte
+}
+
+// openReportQueue opens the queue in dir, creating the directory if needed and
+// removing files left half-written by a crash
+func openReportQueue(dir string, maxBytes int64) (*reportQueue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create buffer directory: %w", err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	for _, path := range leftovers {
+		os.Remove(path)
+	}
+	return &reportQueue{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// push appends a report, then drops the oldest reports while the queue is over its cap
+func (q *reportQueue) push(data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	name := fmt.Sprintf("%020d-%06d.json", time.Now().UnixNano(), q.seq%1000000)
+	tmp := filepath.Join(q.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to buffer report: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, name)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to buffer report: %w", err)
+	}
+
+	q.trim()
+	return nil
+}
+
+// peek returns up to n of the oldest reports without removing them
+func (q *reportQueue) peek(n int) ([]queuedReport, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	names, err := q.names()
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]queuedReport, 0, n)
+	for _, name := range names {
+		if len(reports) == n {
+			break
+		}
+		data, err := os.ReadFile(filepath.Join(q.dir, name))
+		if err != nil {
+			// An unreadable report would block the queue forever
+			slog.Warn("dropping unreadable buffered report", "name", name, "error", err)
+			os.Remove(filepath.Join(q.dir, name))
+			continue
+		}
+		reports = append(reports, queuedReport{name: name, data: data})
+	}
+	return reports, nil
+}
+
+// remove deletes reports returned by peek
+func (q *reportQueue) remove(reports []queuedReport) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, report := range reports {
+		os.Remove(filepath.Join(q.dir, report.name))
+	}
+}
+
+// len returns the number of buffered reports
+func (q *reportQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	names, _ := q.names()
+	return len(names)
+}
+
+// trim drops the oldest reports until the queue fits maxBytes; q.mu must be held
+func (q *reportQueue) trim() {
+	if q.maxBytes <= 0 {
+		return
+	}
+	names, err := q.names()
+	if err != nil {
+		return
+	}
+
+	sizes := make([]int64, len(names))
+	var total int64
+	for i, name := range names {
+		if info, err := os.Stat(filepath.Join(q.dir, name)); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+
+	dropped := 0
+	// Never drop the newest report, even when it alone exceeds the cap
+	for i := 0; i < len(names)-1 && total > q.maxBytes; i++ {
+		if os.Remove(filepath.Join(q.dir, names[i])) == nil {
+			total -= sizes[i]
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		slog.Warn("report buffer full, dropped oldest reports", "count", dropped)
+	}
+}
+
+// names lists the buffered reports, oldest first; q.mu must be held
+func (q *reportQueue) names() ([]string, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read buffer directory: %w", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
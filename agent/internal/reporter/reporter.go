@@ -2,13 +2,16 @@
 package reporter
 
 import (
-	"bytes"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"sync"
 	"time"
+
+	"github.com/wangjialin/myops/agent/internal/collector"
 )
 
 // Reporter reports host information to the server
@@ -17,13 +20,28 @@ type Reporter struct {
 	token    string
 	insecure bool
 	client   *http.Client
+	rpc      *grpcChannel // nil unless EnableGRPC was called
+
+	compression string       // gzip, zstd or "" for HTTP request bodies
+	queue       *reportQueue // nil unless EnableBuffer was called
+	batchSize   int
+	flushMu     sync.Mutex
+	failures    int       // failed flushes in a row
+	retryAt     time.Time // buffered reports are not resent before then
+	retry       chan struct{}
+
+	mu     sync.RWMutex
+	hostID string // assigned by the server on the first successful report
 }
 
 // ReportResponse represents the server response
 type ReportResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
+	Data struct {
+		Success bool   `json:"success"`
+		HostID  string `json:"hostId"`
+		Status  string `json:"status"`
+		Message string `json:"message,omitempty"`
+	} `json:"data"`
 }
 
 // NewReporter creates a new reporter
@@ -47,28 +65,62 @@ func NewReporter(endpoint, token string, insecure bool) *Reporter {
 		token:    token,
 		insecure: insecure,
 		client:   client,
+		retry:    make(chan struct{}, 1),
 	}
 }
 
-// Report reports the host information to the server
+// Report reports the host information to the server, over gRPC when it is enabled
+// and reachable and over HTTP otherwise. With buffering enabled, HTTP reports the
+// server does not take are kept and resent later, and ErrReportBuffered is returned.
 func (r *Reporter) Report(hostInfo interface{}) error {
+	if info, ok := hostInfo.(*collector.HostInfo); ok {
+		if sent, err := r.reportGRPC(info); sent {
+			// Reports buffered while the server was unreachable still go over HTTP
+			if err == nil && r.queue != nil && r.queue.len() > 0 {
+				if err := r.Flush(); err != nil {
+					slog.Warn("resending buffered reports failed", "error", err)
+				}
+			}
+			return err
+		}
+	}
+
 	// Marshal the host info to JSON
 	data, err := json.Marshal(hostInfo)
 	if err != nil {
 		return fmt.Errorf("failed to marshal host info: %w", err)
 	}
 
+	if r.queue != nil {
+		err := r.buffer(data)
+		if err == nil {
+			return r.Flush()
+		}
+		slog.Warn("sending report unbuffered", "error", err)
+	}
+	return r.postReport(data)
+}
+
+// postReport sends a single report
+func (r *Reporter) postReport(data []byte) error {
+	body, encoding, err := r.encode(data)
+	if err != nil {
+		return err
+	}
+
 	// Create the request
 	reportURL := fmt.Sprintf("%s/api/v1/agent/report", r.endpoint)
-	req, err := http.NewRequest("POST", reportURL, bytes.NewReader(data))
+	req, err := http.NewRequest("POST", reportURL, body)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.token))
-	req.Header.Set("User-Agent", "MyOps-Agent/1.0")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	r.setHeaders(req)
 
 	// Send the request
 	resp, err := r.client.Do(req)
@@ -89,9 +141,20 @@ func (r *Reporter) Report(hostInfo interface{}) error {
 		return fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	if !reportResp.Success {
-		return fmt.Errorf("server rejected report: %s", reportResp.Message)
+	if !reportResp.Data.Success {
+		return fmt.Errorf("server rejected report: %s", reportResp.Data.Message)
 	}
 
+	r.mu.Lock()
+	r.hostID = reportResp.Data.HostID
+	r.mu.Unlock()
+
 	return nil
 }
+
+// HostID returns the host ID assigned by the server, or "" before the first successful report
+func (r *Reporter) HostID() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.hostID
+}
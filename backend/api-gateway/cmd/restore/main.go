@@ -0,0 +1,148 @@
+// Package main is the restore command for platform backups. It restores the
+// database from a backup archive after checking the archive can be restored to
+// this build:
+//
+//	restore -file /var/backups/myops/myops-backup-20240101-020000.tar -dry-run
+//	restore -s3 s3://bucket/prefix/myops-backup-20240101-020000.tar -region eu-west-1
+//
+// The gateways should be stopped while the database is restored. S3 credentials
+// are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/wangjialin/myops/api-gateway/internal/config"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func main() {
+	file := flag.String("file", "", "backup archive to restore")
+	s3URL := flag.String("s3", "", "backup archive in S3, as s3://bucket/key")
+	region := flag.String("region", os.Getenv("AWS_REGION"), "S3 region")
+	endpoint := flag.String("endpoint", "", "S3-compatible endpoint; AWS when empty")
+	dryRun := flag.Bool("dry-run", false, "run the pre-flight checks without restoring")
+	force := flag.Bool("force", false, "restore despite a newer schema version or older PostgreSQL server")
+	configOut := flag.String("config-out", "", "write the backup's gateway config to this file")
+	flag.Parse()
+
+	if (*file == "") == (*s3URL == "") {
+		fmt.Fprintln(os.Stderr, "restore: exactly one of -file or -s3 is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(os.Getenv("CONFIG_PATH"))
+	if err != nil {
+		fatalf("failed to load config: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	archive, err := openArchive(ctx, *file, *s3URL, *region, *endpoint)
+	if err != nil {
+		fatalf("failed to open backup: %v", err)
+	}
+	defer archive.Close()
+
+	db, err := gorm.Open(postgres.Open(cfg.Database.DSN()), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: cannot connect to %s: %v\n", cfg.Database.Database, err)
+		db = nil
+	}
+
+	restore, err := service.OpenRestore(ctx, db, service.BackupOptions{
+		DBHost:        cfg.Database.Host,
+		DBPort:        cfg.Database.Port,
+		DBUser:        cfg.Database.User,
+		DBPassword:    cfg.Database.Password,
+		DBName:        cfg.Database.Database,
+		PgRestore:     cfg.Backup.PgRestore,
+		TempDir:       cfg.Backup.TempDir,
+		MigrationsDir: cfg.Health.MigrationsDir,
+	}, archive)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer restore.Close()
+
+	fmt.Printf("Backup of %s created %s, schema version %d\n", restore.Manifest.Database,
+		restore.Manifest.CreatedAt.UTC().Format("2006-01-02 15:04:05 MST"), restore.Manifest.SchemaVersion)
+	for _, check := range restore.Checks {
+		status := "ok"
+		if !check.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("  [%-4s] %-10s %s\n", status, check.Name, check.Message)
+	}
+
+	if *configOut != "" {
+		data, err := restore.GatewayConfig()
+		if err != nil {
+			fatalf("%v", err)
+		}
+		if err := os.WriteFile(*configOut, data, 0600); err != nil {
+			fatalf("failed to write gateway config: %v", err)
+		}
+		fmt.Printf("Gateway config written to %s\n", *configOut)
+	}
+
+	readyErr := restore.Ready(*force)
+	if *dryRun {
+		if readyErr != nil {
+			fatalf("%v", readyErr)
+		}
+		fmt.Println("Pre-flight checks passed; run without -dry-run to restore")
+		return
+	}
+	if readyErr != nil {
+		fatalf("%v", readyErr)
+	}
+
+	fmt.Printf("Restoring %s on %s:%d...\n", cfg.Database.Database, cfg.Database.Host, cfg.Database.Port)
+	if err := restore.Apply(ctx); err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Println("Restore completed")
+}
+
+// openArchive opens the backup from a local file or an S3 object
+func openArchive(ctx context.Context, file, s3URL, region, endpoint string) (io.ReadCloser, error) {
+	if file != "" {
+		return os.Open(file)
+	}
+	u, err := url.Parse(s3URL)
+	if err != nil || u.Scheme != "s3" || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("invalid S3 location %q, expected s3://bucket/key", s3URL)
+	}
+	storage, err := service.NewBackupStorage(&model.BackupTarget{
+		Type:            model.BackupStorageS3,
+		Bucket:          u.Host,
+		Region:          region,
+		Endpoint:        endpoint,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return storage.Get(ctx, strings.Trim(u.Path, "/"))
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "restore: "+format+"\n", args...)
+	os.Exit(1)
+}
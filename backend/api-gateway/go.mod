@@ -5,10 +5,15 @@ go 1.23.0
 require (
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.1
+	github.com/graph-gophers/graphql-go v1.5.0
 	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/klauspost/compress v1.17.11
+	github.com/lib/pq v1.11.1
 	github.com/redis/go-redis/v9 v9.7.0
+	github.com/robfig/cron/v3 v3.0.1
 	go.uber.org/zap v1.27.0
 	golang.org/x/time v0.8.0
+	google.golang.org/grpc v1.67.1
 	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/postgres v1.5.9
 	gorm.io/gorm v1.25.12
@@ -19,6 +24,5 @@ require (
 	github.com/go-asn1-ber/asn1-ber v1.5.8-0.20250403174932-29230038a667 // indirect
 	github.com/go-ldap/ldap/v3 v3.4.12 // indirect
 	github.com/google/uuid v1.6.0 // indirect
-	github.com/lib/pq v1.11.1 // indirect
 	golang.org/x/crypto v0.36.0 // indirect
 )
@@ -0,0 +1,381 @@
+// Package agentrpc provides the gRPC service host agents register, report and take
+// commands over. It shares its services with the /api/v1/agent HTTP endpoints, which
+// agents fall back to when the gRPC port cannot be reached.
+package agentrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/config"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	agentpb "github.com/wangjialin/myops/pkg/proto/agent"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // Agents compress their reports
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// reportReceived is the message acknowledging every accepted report
+const reportReceived = "Report received successfully"
+
+// Server serves the agent gRPC service
+type Server struct {
+	agentpb.UnimplementedAgentServiceServer
+
+	reports  *service.AgentReportService
+	commands *service.AgentCommandService
+	config   config.AgentRPCConfig
+	logger   *zap.Logger
+	grpc     *grpc.Server
+
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewServer creates the agent gRPC server. It loads the TLS key pair when one is
+// configured and otherwise serves plaintext.
+func NewServer(reports *service.AgentReportService, commands *service.AgentCommandService, cfg config.AgentRPCConfig, logger *zap.Logger) (*Server, error) {
+	s := &Server{
+		reports:  reports,
+		commands: commands,
+		config:   cfg,
+		logger:   logger,
+		done:     make(chan struct{}),
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(cfg.MaxMessageSize),
+		grpc.UnaryInterceptor(authenticateUnary),
+		grpc.StreamInterceptor(authenticateStream),
+		// Agents idle on their command channel between commands, so keep the
+		// connection open through proxies that drop quiet connections
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: 2 * time.Minute, Timeout: 20 * time.Second}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: 30 * time.Second, PermitWithoutStream: true}),
+	}
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		creds, err := credentials.NewServerTLSFromFile(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load agent RPC TLS key pair: %w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	} else {
+		logger.Warn("agent RPC TLS is not configured, agents connect in plaintext")
+	}
+
+	s.grpc = grpc.NewServer(opts...)
+	agentpb.RegisterAgentServiceServer(s.grpc, s)
+	return s, nil
+}
+
+// Listen opens the configured port
+func (s *Server) Listen() (net.Listener, error) {
+	return net.Listen("tcp", fmt.Sprintf(":%d", s.config.Port))
+}
+
+// Serve accepts agent connections on listener until the server stops
+func (s *Server) Serve(listener net.Listener) error {
+	return s.grpc.Serve(listener)
+}
+
+// Shutdown ends the open streams so their agents reconnect to another gateway,
+// then waits for the running calls until ctx is done
+func (s *Server) Shutdown(ctx context.Context) {
+	s.stopOnce.Do(func() { close(s.done) })
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpc.Stop()
+	}
+}
+
+// Register records the first report of a host and returns its ID
+func (s *Server) Register(ctx context.Context, report *agentpb.HostReport) (*agentpb.ReportAck, error) {
+	return s.report(ctx, report)
+}
+
+// Heartbeat marks the host as seen
+func (s *Server) Heartbeat(ctx context.Context, req *agentpb.HeartbeatRequest) (*agentpb.HeartbeatResponse, error) {
+	hostID, err := uuid.Parse(req.HostId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid host ID")
+	}
+	host, err := s.reports.Heartbeat(agentToken(ctx), hostID)
+	if err != nil {
+		return nil, hostError(err)
+	}
+	return &agentpb.HeartbeatResponse{Status: string(host.Status)}, nil
+}
+
+// StreamReports records each report received on the stream and acknowledges it
+func (s *Server) StreamReports(stream agentpb.AgentService_StreamReportsServer) error {
+	reports := make(chan *agentpb.HostReport)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			report, err := stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case reports <- report:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-s.done:
+			return status.Error(codes.Unavailable, "server shutting down")
+		case err := <-errc:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case report := <-reports:
+			ack, err := s.report(stream.Context(), report)
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(ack); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// CommandChannel sends the host's queued commands as they are dispatched and
+// records the results the agent sends back. The first message must be a hello
+// naming the host.
+func (s *Server) CommandChannel(stream agentpb.AgentService_CommandChannelServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	hello := first.GetHello()
+	if hello == nil {
+		return status.Error(codes.InvalidArgument, "command channel must start with a hello")
+	}
+	hostID, err := uuid.Parse(hello.HostId)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid host ID")
+	}
+	if _, err := s.reports.Heartbeat(agentToken(stream.Context()), hostID); err != nil {
+		return hostError(err)
+	}
+
+	wake, unsubscribe := s.commands.Subscribe(hostID)
+	defer unsubscribe()
+
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			if result := msg.GetResult(); result != nil {
+				s.complete(hostID, result)
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(s.config.CommandPollInterval)
+	defer ticker.Stop()
+
+	for {
+		commands, err := s.commands.Poll(hostID)
+		if err != nil {
+			s.logger.Warn("failed to poll agent commands", zap.String("host_id", hostID.String()), zap.Error(err))
+		}
+		for _, cmd := range commands {
+			if err := stream.Send(&agentpb.Command{
+				Id:        cmd.ID.String(),
+				Type:      string(cmd.Type),
+				Args:      cmd.Args,
+				Timeout:   cmd.Timeout,
+				RequestId: cmd.RequestID,
+			}); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-s.done:
+			return status.Error(codes.Unavailable, "server shutting down")
+		case err := <-errc:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// complete records a command result. Results for commands that already timed out
+// are dropped.
+func (s *Server) complete(hostID uuid.UUID, result *agentpb.CommandResult) {
+	commandID, err := uuid.Parse(result.CommandId)
+	if err != nil {
+		return
+	}
+	err = s.commands.Complete(hostID, commandID, &model.AgentCommandResult{
+		ExitCode: result.ExitCode,
+		Output:   result.Output,
+		Error:    result.Error,
+	})
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.logger.Warn("failed to record agent command result", zap.String("command_id", result.CommandId), zap.Error(err))
+	}
+}
+
+func (s *Server) report(ctx context.Context, report *agentpb.HostReport) (*agentpb.ReportAck, error) {
+	if report.IpAddress == "" {
+		return nil, status.Error(codes.InvalidArgument, "IP address is required")
+	}
+	out := agentReport(report)
+	out.Token = agentToken(ctx)
+	host, err := s.reports.Report(out)
+	if err != nil {
+		return nil, hostError(err)
+	}
+	return &agentpb.ReportAck{
+		HostId:  host.ID.String(),
+		Status:  string(host.Status),
+		Message: reportReceived,
+	}, nil
+}
+
+// agentReport converts a report to the form the report service records
+func agentReport(report *agentpb.HostReport) *service.AgentReport {
+	out := &service.AgentReport{
+		Hostname:      report.Hostname,
+		IPAddress:     report.IpAddress,
+		OSType:        report.OsType,
+		OSVersion:     report.OsVersion,
+		KernelVersion: report.KernelVersion,
+		Arch:          report.Arch,
+		CPUModel:      report.CpuModel,
+		CPUCores:      report.CpuCores,
+		MemoryTotal:   report.MemoryTotal,
+		Disks:         make([]model.HostDiskUsage, 0, len(report.Disks)),
+		PluginHash:    report.PluginHash,
+	}
+	if len(report.Plugins) > 0 {
+		out.Plugins = make(map[string]model.AgentPluginOutput, len(report.Plugins))
+		for name, plugin := range report.Plugins {
+			output := model.AgentPluginOutput{Error: plugin.Error}
+			if plugin.Data != "" {
+				output.Data = json.RawMessage(plugin.Data)
+			}
+			if plugin.CollectedAt > 0 {
+				output.CollectedAt = time.UnixMilli(plugin.CollectedAt)
+			}
+			out.Plugins[name] = output
+		}
+	}
+	for _, disk := range report.Disks {
+		out.Disks = append(out.Disks, model.HostDiskUsage{
+			Device:     disk.Device,
+			MountPoint: disk.MountPoint,
+			FileSystem: disk.FileSystem,
+			Total:      disk.Total,
+			Used:       disk.Used,
+			Free:       disk.Free,
+		})
+	}
+	if m := report.Metrics; m != nil {
+		out.Metrics = &model.HostMetricsReport{
+			CPUUsagePercent: m.CpuUsagePercent,
+			Load1:           m.Load1,
+			Load5:           m.Load5,
+			Load15:          m.Load15,
+			MemoryUsed:      m.MemoryUsed,
+			MemoryAvailable: m.MemoryAvailable,
+			SwapUsed:        m.SwapUsed,
+			UptimeSeconds:   m.UptimeSeconds,
+		}
+		for _, counter := range m.Networks {
+			out.Metrics.Networks = append(out.Metrics.Networks, model.HostNetworkCounter{
+				Name:      counter.Name,
+				BytesSent: counter.BytesSent,
+				BytesRecv: counter.BytesRecv,
+			})
+		}
+	}
+	return out
+}
+
+// hostError converts a report service error to the status returned to the agent
+func hostError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrAgentTokenInvalid), errors.Is(err, service.ErrAgentTokenRevoked):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrAgentHostNotFound):
+		return status.Error(codes.NotFound, "host not found")
+	case errors.Is(err, service.ErrAgentHostRejected):
+		return status.Error(codes.PermissionDenied, "host has been rejected or decommissioned")
+	default:
+		return status.Error(codes.Internal, "failed to record report")
+	}
+}
+
+// authenticate requires an agent token, as the HTTP agent endpoints do. Whether
+// it is the host's own or the shared token is checked along with the host.
+func authenticate(ctx context.Context) error {
+	if agentToken(ctx) == "" {
+		return status.Error(codes.Unauthenticated, "missing agent token")
+	}
+	return nil
+}
+
+// agentToken returns the agent token of a call
+func agentToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if token, ok := strings.CutPrefix(value, "Bearer "); ok && token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+func authenticateUnary(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+	if err := authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return next(ctx, req)
+}
+
+func authenticateStream(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+	if err := authenticate(stream.Context()); err != nil {
+		return err
+	}
+	return next(srv, stream)
+}
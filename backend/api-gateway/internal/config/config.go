@@ -3,8 +3,10 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -12,11 +14,27 @@ import (
 
 // Config represents the application configuration
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	Redis    RedisConfig    `yaml:"redis"`
-	JWT      JWTConfig      `yaml:"jwt"`
-	LDAP     LDAPConfig     `yaml:"ldap"`
+	Server       ServerConfig       `yaml:"server"`
+	Database     DatabaseConfig     `yaml:"database"`
+	Redis        RedisConfig        `yaml:"redis"`
+	JWT          JWTConfig          `yaml:"jwt"`
+	LDAP         LDAPConfig         `yaml:"ldap"`
+	Metrics      MetricsConfig      `yaml:"metrics"`
+	Cost         CostConfig         `yaml:"cost"`
+	LLM          LLMConfig          `yaml:"llm"`
+	Hosts        HostsConfig        `yaml:"hosts"`
+	Health       HealthConfig       `yaml:"health"`
+	Settings     SettingsConfig     `yaml:"settings"`
+	Backup       BackupConfig       `yaml:"backup"`
+	GitOps       GitOpsConfig       `yaml:"gitops"`
+	WebSocket    WebSocketConfig    `yaml:"websocket"`
+	AgentRPC     AgentRPCConfig     `yaml:"agent_rpc"`
+	Security     SecurityConfig     `yaml:"security"`
+	ClusterCache ClusterCacheConfig `yaml:"cluster_cache"`
+	Latency      LatencyConfig      `yaml:"latency"`
+
+	// Path is the file the configuration was loaded from, if any
+	Path string `yaml:"-"`
 }
 
 // ServerConfig holds HTTP server configuration
@@ -35,6 +53,13 @@ type DatabaseConfig struct {
 	User     string `yaml:"user" env:"DB_USER" default:"myops"`
 	Password string `yaml:"password" env:"DB_PASSWORD" default:"myops_dev_pass"`
 	Database string `yaml:"database" env:"DB_NAME" default:"myops"`
+
+	// Connection failures in a row that open the circuit breaker, which refuses
+	// writes for BreakerCooldown; failed reads are retried ReadRetries times
+	FailureThreshold int           `yaml:"failure_threshold" env:"DB_FAILURE_THRESHOLD" default:"5"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown" env:"DB_BREAKER_COOLDOWN" default:"10s"`
+	ReadRetries      int           `yaml:"read_retries" env:"DB_READ_RETRIES" default:"2"`
+	RetryBackoff     time.Duration `yaml:"retry_backoff" env:"DB_RETRY_BACKOFF" default:"100ms"`
 }
 
 // DSN returns the database connection string
@@ -69,9 +94,138 @@ type LDAPConfig struct {
 	UserFilter   string `yaml:"user_filter" env:"LDAP_USER_FILTER" default:"(uid=%s)"`
 }
 
+// MetricsConfig holds cluster metrics collection configuration
+type MetricsConfig struct {
+	CollectInterval  time.Duration `yaml:"collect_interval" env:"METRICS_COLLECT_INTERVAL" default:"1m"`
+	Retention        time.Duration `yaml:"retention" env:"METRICS_RETENTION" default:"168h"`
+	KubeStateMetrics bool          `yaml:"kube_state_metrics" env:"METRICS_KUBE_STATE_METRICS" default:"true"`
+}
+
+// CostConfig holds the default pricing used when a cluster has no pricing of its own
+type CostConfig struct {
+	CPUHourly       float64 `yaml:"cpu_hourly" env:"COST_CPU_HOURLY" default:"0.031611"`
+	MemoryGiBHourly float64 `yaml:"memory_gib_hourly" env:"COST_MEMORY_GIB_HOURLY" default:"0.004237"`
+	Currency        string  `yaml:"currency" env:"COST_CURRENCY" default:"USD"`
+}
+
+// LLMConfig holds the OpenAI-compatible chat completion endpoint used by the AI assistant.
+// The assistant answers with a placeholder when BaseURL is empty.
+type LLMConfig struct {
+	BaseURL string        `yaml:"base_url" env:"LLM_BASE_URL" default:""`
+	APIKey  string        `yaml:"api_key" env:"LLM_API_KEY" default:""`
+	Model   string        `yaml:"model" env:"LLM_MODEL" default:"gpt-4o-mini"`
+	Timeout time.Duration `yaml:"timeout" env:"LLM_TIMEOUT" default:"60s"`
+}
+
+// HostsConfig holds agent heartbeat tracking. Hosts whose agent has been silent for
+// DegradedAfter become degraded, and offline after OfflineAfter. AgentToken is the
+// shared token agents of hosts not issued their own token authenticate with; when
+// empty, only hosts with their own token are accepted.
+type HostsConfig struct {
+	HeartbeatCheckInterval time.Duration `yaml:"heartbeat_check_interval" env:"HOSTS_HEARTBEAT_CHECK_INTERVAL" default:"30s"`
+	DegradedAfter          time.Duration `yaml:"degraded_after" env:"HOSTS_DEGRADED_AFTER" default:"2m"`
+	OfflineAfter           time.Duration `yaml:"offline_after" env:"HOSTS_OFFLINE_AFTER" default:"5m"`
+	AgentToken             string        `yaml:"agent_token" env:"HOSTS_AGENT_TOKEN" default:""`
+}
+
+// HealthConfig holds readiness checking. MigrationsDir is compared against the
+// applied schema version; CheckTimeout bounds each component check.
+type HealthConfig struct {
+	MigrationsDir string        `yaml:"migrations_dir" env:"HEALTH_MIGRATIONS_DIR" default:"migrations"`
+	CheckTimeout  time.Duration `yaml:"check_timeout" env:"HEALTH_CHECK_TIMEOUT" default:"3s"`
+}
+
+// SettingsConfig holds runtime settings. Stored settings and feature flags are
+// reloaded every RefreshInterval so changes made on other gateway instances apply
+// here too.
+type SettingsConfig struct {
+	RefreshInterval time.Duration `yaml:"refresh_interval" env:"SETTINGS_REFRESH_INTERVAL" default:"30s"`
+}
+
+// BackupConfig holds the PostgreSQL client tools backups run and where archives
+// are assembled before they are uploaded to a target
+type BackupConfig struct {
+	PgDump    string `yaml:"pg_dump" env:"BACKUP_PG_DUMP" default:"pg_dump"`
+	PgRestore string `yaml:"pg_restore" env:"BACKUP_PG_RESTORE" default:"pg_restore"`
+	TempDir   string `yaml:"temp_dir" env:"BACKUP_TEMP_DIR" default:""`
+}
+
+// GitOpsConfig holds the Git client GitOps syncs fetch repositories with and
+// where they keep their clones
+type GitOpsConfig struct {
+	Git     string `yaml:"git" env:"GITOPS_GIT" default:"git"`
+	WorkDir string `yaml:"work_dir" env:"GITOPS_WORK_DIR" default:""`
+}
+
+// WebSocketConfig holds the limits of log, terminal, port-forward and event stream
+// websockets. Pages served from the gateway and the CORS origins may always
+// connect; AllowedOrigins adds more. Connections silent for PongWait are closed.
+type WebSocketConfig struct {
+	AllowedOrigins  []string      `yaml:"allowed_origins" env:"WS_ALLOWED_ORIGINS" default:""`
+	PingInterval    time.Duration `yaml:"ping_interval" env:"WS_PING_INTERVAL" default:"30s"`
+	PongWait        time.Duration `yaml:"pong_wait" env:"WS_PONG_WAIT" default:"75s"`
+	WriteWait       time.Duration `yaml:"write_wait" env:"WS_WRITE_WAIT" default:"10s"`
+	MaxMessageSize  int64         `yaml:"max_message_size" env:"WS_MAX_MESSAGE_SIZE" default:"1048576"`
+	MaxConnsPerUser int           `yaml:"max_conns_per_user" env:"WS_MAX_CONNS_PER_USER" default:"20"`
+}
+
+// SecurityConfig holds the browser security policy of the deployment. CORSOrigins
+// is the default of the security.cors_origins setting, so each environment can
+// ship its own origins.
+type SecurityConfig struct {
+	CORSOrigins []string `yaml:"cors_origins" env:"CORS_ALLOWED_ORIGINS" default:"http://localhost:3000,http://localhost:5173"`
+}
+
+// ClusterCacheConfig holds the informer caches workload lists of connected
+// clusters are served from. A cluster's cache starts on its first read, holds
+// Namespaces or every namespace, and is dropped after IdleTimeout without reads
+// or once it would hold more than MaxObjects objects.
+type ClusterCacheConfig struct {
+	Enabled     bool          `yaml:"enabled" env:"CLUSTER_CACHE_ENABLED" default:"false"`
+	Namespaces  []string      `yaml:"namespaces" env:"CLUSTER_CACHE_NAMESPACES" default:""`
+	MaxObjects  int           `yaml:"max_objects" env:"CLUSTER_CACHE_MAX_OBJECTS" default:"20000"`
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"CLUSTER_CACHE_IDLE_TIMEOUT" default:"30m"`
+}
+
+// AgentRPCConfig holds the gRPC service agents report and take commands over,
+// which is disabled when Port is 0. The service uses TLS when TLSCert and TLSKey
+// are set. Command channels look for commands queued on other gateway instances
+// every CommandPollInterval.
+type AgentRPCConfig struct {
+	Port                int           `yaml:"port" env:"AGENT_RPC_PORT" default:"9443"`
+	TLSCert             string        `yaml:"tls_cert" env:"AGENT_RPC_TLS_CERT" default:""`
+	TLSKey              string        `yaml:"tls_key" env:"AGENT_RPC_TLS_KEY" default:""`
+	CommandPollInterval time.Duration `yaml:"command_poll_interval" env:"AGENT_RPC_COMMAND_POLL_INTERVAL" default:"10s"`
+	MaxMessageSize      int           `yaml:"max_message_size" env:"AGENT_RPC_MAX_MESSAGE_SIZE" default:"4194304"`
+}
+
+// LatencyConfig holds the latency SLOs of the gateway's routes. A route's p95
+// and p99 over Window are held to P95 and P99, or to its entry in Routes, once
+// it served MinRequests requests in the window; routes are keyed by method and
+// path, IDs replaced by *, such as "GET /api/v1/hosts/*". Breaches raise alerts
+// owned by AlertUserID when it is set. Requests taking SlowRequest or longer and
+// statements taking SlowQuery or longer are logged with their database timings.
+type LatencyConfig struct {
+	Window      time.Duration                 `yaml:"window" env:"LATENCY_WINDOW" default:"5m"`
+	P95         time.Duration                 `yaml:"p95" env:"LATENCY_P95" default:"1s"`
+	P99         time.Duration                 `yaml:"p99" env:"LATENCY_P99" default:"3s"`
+	MinRequests int                           `yaml:"min_requests" env:"LATENCY_MIN_REQUESTS" default:"20"`
+	Routes      map[string]RouteLatencyConfig `yaml:"routes"`
+	AlertUserID string                        `yaml:"alert_user_id" env:"LATENCY_ALERT_USER_ID" default:""`
+	SlowRequest time.Duration                 `yaml:"slow_request" env:"LATENCY_SLOW_REQUEST" default:"2s"`
+	SlowQuery   time.Duration                 `yaml:"slow_query" env:"LATENCY_SLOW_QUERY" default:"500ms"`
+}
+
+// RouteLatencyConfig overrides the latency SLO of a route. Thresholds left at 0
+// keep the default.
+type RouteLatencyConfig struct {
+	P95 time.Duration `yaml:"p95"`
+	P99 time.Duration `yaml:"p99"`
+}
+
 // Load loads configuration from file and environment variables
 func Load(path string) (*Config, error) {
-	cfg := &Config{}
+	cfg := &Config{Path: path}
 
 	// Set defaults
 	cfg.Server = ServerConfig{
@@ -87,6 +241,11 @@ func Load(path string) (*Config, error) {
 		User:     "myops",
 		Password: "myops_dev_pass",
 		Database: "myops",
+
+		FailureThreshold: 5,
+		BreakerCooldown:  10 * time.Second,
+		ReadRetries:      2,
+		RetryBackoff:     100 * time.Millisecond,
 	}
 	cfg.Redis = RedisConfig{
 		Addr:     "localhost:6379",
@@ -109,6 +268,67 @@ func Load(path string) (*Config, error) {
 		UserFilter:   "(uid=%s)",
 	}
 
+	cfg.Metrics = MetricsConfig{
+		CollectInterval:  time.Minute,
+		Retention:        168 * time.Hour, // 7 days
+		KubeStateMetrics: true,
+	}
+	cfg.Cost = CostConfig{
+		CPUHourly:       0.031611,
+		MemoryGiBHourly: 0.004237,
+		Currency:        "USD",
+	}
+	cfg.LLM = LLMConfig{
+		Model:   "gpt-4o-mini",
+		Timeout: 60 * time.Second,
+	}
+	cfg.Hosts = HostsConfig{
+		HeartbeatCheckInterval: 30 * time.Second,
+		DegradedAfter:          2 * time.Minute,
+		OfflineAfter:           5 * time.Minute,
+	}
+	cfg.Health = HealthConfig{
+		MigrationsDir: "migrations",
+		CheckTimeout:  3 * time.Second,
+	}
+	cfg.Settings = SettingsConfig{
+		RefreshInterval: 30 * time.Second,
+	}
+	cfg.Backup = BackupConfig{
+		PgDump:    "pg_dump",
+		PgRestore: "pg_restore",
+	}
+	cfg.GitOps = GitOpsConfig{
+		Git: "git",
+	}
+	cfg.WebSocket = WebSocketConfig{
+		PingInterval:    30 * time.Second,
+		PongWait:        75 * time.Second,
+		WriteWait:       10 * time.Second,
+		MaxMessageSize:  1 << 20,
+		MaxConnsPerUser: 20,
+	}
+	cfg.AgentRPC = AgentRPCConfig{
+		Port:                9443,
+		CommandPollInterval: 10 * time.Second,
+		MaxMessageSize:      4 << 20,
+	}
+	cfg.Security = SecurityConfig{
+		CORSOrigins: []string{"http://localhost:3000", "http://localhost:5173"},
+	}
+	cfg.ClusterCache = ClusterCacheConfig{
+		MaxObjects:  20000,
+		IdleTimeout: 30 * time.Minute,
+	}
+	cfg.Latency = LatencyConfig{
+		Window:      5 * time.Minute,
+		P95:         time.Second,
+		P99:         3 * time.Second,
+		MinRequests: 20,
+		SlowRequest: 2 * time.Second,
+		SlowQuery:   500 * time.Millisecond,
+	}
+
 	// Load from file if provided
 	if path != "" {
 		data, err := os.ReadFile(path)
@@ -135,6 +355,26 @@ func Load(path string) (*Config, error) {
 	if v := os.Getenv("DB_PASSWORD"); v != "" {
 		cfg.Database.Password = v
 	}
+	if v := os.Getenv("DB_FAILURE_THRESHOLD"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.Database.FailureThreshold = i
+		}
+	}
+	if v := os.Getenv("DB_BREAKER_COOLDOWN"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Database.BreakerCooldown = d
+		}
+	}
+	if v := os.Getenv("DB_READ_RETRIES"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.Database.ReadRetries = i
+		}
+	}
+	if v := os.Getenv("DB_RETRY_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Database.RetryBackoff = d
+		}
+	}
 	if v := os.Getenv("REDIS_ADDR"); v != "" {
 		cfg.Redis.Addr = v
 	}
@@ -154,5 +394,225 @@ func Load(path string) (*Config, error) {
 		cfg.LDAP.UserFilter = v
 	}
 
+	if v := os.Getenv("METRICS_COLLECT_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Metrics.CollectInterval = d
+		}
+	}
+	if v := os.Getenv("METRICS_RETENTION"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Metrics.Retention = d
+		}
+	}
+	if v := os.Getenv("METRICS_KUBE_STATE_METRICS"); v != "" {
+		cfg.Metrics.KubeStateMetrics = v == "true"
+	}
+	if v := os.Getenv("COST_CPU_HOURLY"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.Cost.CPUHourly = f
+		}
+	}
+	if v := os.Getenv("COST_MEMORY_GIB_HOURLY"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.Cost.MemoryGiBHourly = f
+		}
+	}
+	if v := os.Getenv("COST_CURRENCY"); v != "" {
+		cfg.Cost.Currency = v
+	}
+	if v := os.Getenv("LLM_BASE_URL"); v != "" {
+		cfg.LLM.BaseURL = v
+	}
+	if v := os.Getenv("LLM_API_KEY"); v != "" {
+		cfg.LLM.APIKey = v
+	}
+	if v := os.Getenv("LLM_MODEL"); v != "" {
+		cfg.LLM.Model = v
+	}
+	if v := os.Getenv("LLM_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.LLM.Timeout = d
+		}
+	}
+	if v := os.Getenv("HOSTS_HEARTBEAT_CHECK_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Hosts.HeartbeatCheckInterval = d
+		}
+	}
+	if v := os.Getenv("HOSTS_DEGRADED_AFTER"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Hosts.DegradedAfter = d
+		}
+	}
+	if v := os.Getenv("HOSTS_OFFLINE_AFTER"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Hosts.OfflineAfter = d
+		}
+	}
+	if v := os.Getenv("HOSTS_AGENT_TOKEN"); v != "" {
+		cfg.Hosts.AgentToken = v
+	}
+	if v := os.Getenv("HEALTH_MIGRATIONS_DIR"); v != "" {
+		cfg.Health.MigrationsDir = v
+	}
+	if v := os.Getenv("HEALTH_CHECK_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Health.CheckTimeout = d
+		}
+	}
+	if v := os.Getenv("SETTINGS_REFRESH_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Settings.RefreshInterval = d
+		}
+	}
+	if v := os.Getenv("BACKUP_PG_DUMP"); v != "" {
+		cfg.Backup.PgDump = v
+	}
+	if v := os.Getenv("BACKUP_PG_RESTORE"); v != "" {
+		cfg.Backup.PgRestore = v
+	}
+	if v := os.Getenv("BACKUP_TEMP_DIR"); v != "" {
+		cfg.Backup.TempDir = v
+	}
+	if v := os.Getenv("GITOPS_GIT"); v != "" {
+		cfg.GitOps.Git = v
+	}
+	if v := os.Getenv("GITOPS_WORK_DIR"); v != "" {
+		cfg.GitOps.WorkDir = v
+	}
+	if v := os.Getenv("WS_ALLOWED_ORIGINS"); v != "" {
+		cfg.WebSocket.AllowedOrigins = strings.Split(v, ",")
+	}
+	if v := os.Getenv("WS_PING_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.WebSocket.PingInterval = d
+		}
+	}
+	if v := os.Getenv("WS_PONG_WAIT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.WebSocket.PongWait = d
+		}
+	}
+	if v := os.Getenv("WS_WRITE_WAIT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.WebSocket.WriteWait = d
+		}
+	}
+	if v := os.Getenv("WS_MAX_MESSAGE_SIZE"); v != "" {
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.WebSocket.MaxMessageSize = i
+		}
+	}
+	if v := os.Getenv("WS_MAX_CONNS_PER_USER"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.WebSocket.MaxConnsPerUser = i
+		}
+	}
+	if v := os.Getenv("AGENT_RPC_PORT"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.AgentRPC.Port = i
+		}
+	}
+	if v := os.Getenv("AGENT_RPC_TLS_CERT"); v != "" {
+		cfg.AgentRPC.TLSCert = v
+	}
+	if v := os.Getenv("AGENT_RPC_TLS_KEY"); v != "" {
+		cfg.AgentRPC.TLSKey = v
+	}
+	if v := os.Getenv("AGENT_RPC_COMMAND_POLL_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.AgentRPC.CommandPollInterval = d
+		}
+	}
+	if v := os.Getenv("AGENT_RPC_MAX_MESSAGE_SIZE"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.AgentRPC.MaxMessageSize = i
+		}
+	}
+	if v := os.Getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		cfg.Security.CORSOrigins = strings.Split(v, ",")
+	}
+	if v := os.Getenv("CLUSTER_CACHE_ENABLED"); v != "" {
+		cfg.ClusterCache.Enabled = v == "true"
+	}
+	if v := os.Getenv("CLUSTER_CACHE_NAMESPACES"); v != "" {
+		cfg.ClusterCache.Namespaces = strings.Split(v, ",")
+	}
+	if v := os.Getenv("CLUSTER_CACHE_MAX_OBJECTS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.ClusterCache.MaxObjects = i
+		}
+	}
+	if v := os.Getenv("CLUSTER_CACHE_IDLE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.ClusterCache.IdleTimeout = d
+		}
+	}
+	if v := os.Getenv("LATENCY_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Latency.Window = d
+		}
+	}
+	if v := os.Getenv("LATENCY_P95"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Latency.P95 = d
+		}
+	}
+	if v := os.Getenv("LATENCY_P99"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Latency.P99 = d
+		}
+	}
+	if v := os.Getenv("LATENCY_MIN_REQUESTS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.Latency.MinRequests = i
+		}
+	}
+	if v := os.Getenv("LATENCY_ALERT_USER_ID"); v != "" {
+		cfg.Latency.AlertUserID = v
+	}
+	if v := os.Getenv("LATENCY_SLOW_REQUEST"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Latency.SlowRequest = d
+		}
+	}
+	if v := os.Getenv("LATENCY_SLOW_QUERY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Latency.SlowQuery = d
+		}
+	}
+
 	return cfg, nil
 }
+
+// redacted replaces secrets in the configuration
+const redacted = "[REDACTED]"
+
+// Redacted returns a copy of the configuration with its passwords and keys, and
+// credentials embedded in URLs, replaced, for the diagnostics bundle
+func (c *Config) Redacted() *Config {
+	r := *c
+	redact := func(s *string) {
+		if *s != "" {
+			*s = redacted
+		}
+	}
+	redact(&r.Database.Password)
+	redact(&r.Redis.Password)
+	redact(&r.LDAP.BindPassword)
+	redact(&r.LLM.APIKey)
+
+	r.Redis.Addr = redactURL(r.Redis.Addr)
+	r.LDAP.URL = redactURL(r.LDAP.URL)
+	r.LLM.BaseURL = redactURL(r.LLM.BaseURL)
+	return &r
+}
+
+// redactURL masks the password of a URL's user info
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,385 @@
+// Package handler provides HTTP handlers for the account lifecycle
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	apperrors "github.com/wangjialin/myops/pkg/errors"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// AccountHandler handles invitations, password resets, MFA and lockouts
+type AccountHandler struct {
+	db       *gorm.DB
+	accounts *service.AccountService
+	auth     *service.AuthService
+}
+
+// NewAccountHandler creates a new account handler
+func NewAccountHandler(db *gorm.DB, accounts *service.AccountService, auth *service.AuthService) *AccountHandler {
+	return &AccountHandler{db: db, accounts: accounts, auth: auth}
+}
+
+// ListInvitations lists invitations with their status
+func (h *AccountHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "users", "list", nil, "") {
+		return
+	}
+
+	invitations, err := h.accounts.ListInvitations()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list invitations")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  invitations,
+		"total": len(invitations),
+	})
+}
+
+// CreateInvitation invites a user by email
+func (h *AccountHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "users", "manage", nil, "") {
+		return
+	}
+
+	var req model.CreateInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	result, err := h.accounts.Invite(&req, userID)
+	if err != nil {
+		respondWithAccountError(w, err, "Failed to create invitation")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, result)
+}
+
+// DeleteInvitation revokes a pending invitation
+func (h *AccountHandler) DeleteInvitation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "users", "manage", nil, "") {
+		return
+	}
+
+	// /api/v1/invitations/{id}
+	id, ok := pathUUID(w, r, 3, "invitation")
+	if !ok {
+		return
+	}
+	if err := h.accounts.RevokeInvitation(id); errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Pending invitation not found")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to revoke invitation")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Invitation revoked successfully",
+	})
+}
+
+// AcceptInvitation creates the invited account and signs it in
+func (h *AccountHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	var req model.AcceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	user, err := h.accounts.AcceptInvitation(r.Context(), &req)
+	if err != nil {
+		respondWithAccountError(w, err, "Failed to accept invitation")
+		return
+	}
+	resp, err := h.auth.IssueTokens(r.Context(), user, user.Username)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Account created but sign in failed")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+// RequestPasswordReset emails a password reset link
+func (h *AccountHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	var req model.PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	// The response is the same whether or not the address has an account
+	if err := h.accounts.RequestPasswordReset(req.Email); err != nil {
+		respondWithAccountError(w, err, "Failed to request password reset")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"message": "If the address belongs to an account, a reset link has been sent",
+	})
+}
+
+// ConfirmPasswordReset sets a new password with a reset token
+func (h *AccountHandler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	var req model.ConfirmPasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	userID, err := h.accounts.ResetPassword(&req)
+	if err != nil {
+		respondWithAccountError(w, err, "Failed to reset password")
+		return
+	}
+	// Sessions opened with the old password end with the reset
+	if err := h.auth.RevokeRefreshToken(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Password reset but sessions could not be revoked")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Password reset successfully",
+	})
+}
+
+// VerifyMFA completes a login with a TOTP or recovery code
+func (h *AccountHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	var req model.MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	resp, err := h.auth.VerifyMFA(r.Context(), &req)
+	if err != nil {
+		respondWithAccountError(w, err, "Failed to verify code")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// GetMFAStatus returns the caller's MFA state
+func (h *AccountHandler) GetMFAStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.accounts.MFAStatus(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get MFA status")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, status)
+}
+
+// EnrollMFA starts TOTP enrollment for the caller
+func (h *AccountHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var user model.User
+	if err := h.db.First(&user, "id = ?", userID).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
+		return
+	}
+	enrollment, err := h.accounts.EnrollMFA(&user)
+	if err != nil {
+		respondWithAccountError(w, err, "Failed to start MFA enrollment")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, enrollment)
+}
+
+// ActivateMFA enables the caller's pending enrollment and returns recovery codes
+func (h *AccountHandler) ActivateMFA(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.mfaCodeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.accounts.ActivateMFA(userID, req.Code)
+	if err != nil {
+		respondWithAccountError(w, err, "Failed to activate MFA")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"recoveryCodes": codes,
+	})
+}
+
+// DisableMFA turns off the caller's MFA
+func (h *AccountHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.mfaCodeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.accounts.DisableMFA(userID, req.Code); err != nil {
+		respondWithAccountError(w, err, "Failed to disable MFA")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "MFA disabled successfully",
+	})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes
+func (h *AccountHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := h.mfaCodeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.accounts.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		respondWithAccountError(w, err, "Failed to regenerate recovery codes")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"recoveryCodes": codes,
+	})
+}
+
+// UnlockUser lifts a user's lockout
+func (h *AccountHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "users", "manage", nil, "") {
+		return
+	}
+
+	// /api/v1/users/{id}/unlock
+	target, ok := pathUUID(w, r, 3, "user")
+	if !ok {
+		return
+	}
+	if err := h.accounts.Unlock(target); errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to unlock user")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "User unlocked successfully",
+	})
+}
+
+// ResetUserMFA removes a user's MFA so they can enroll again
+func (h *AccountHandler) ResetUserMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "users", "manage", nil, "") {
+		return
+	}
+
+	// /api/v1/users/{id}/mfa
+	target, ok := pathUUID(w, r, 3, "user")
+	if !ok {
+		return
+	}
+	if err := h.accounts.ResetMFA(target); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to reset MFA")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "MFA reset successfully",
+	})
+}
+
+func (h *AccountHandler) mfaCodeRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, *model.MFACodeRequest, bool) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return userID, nil, false
+	}
+	var req model.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return userID, nil, false
+	}
+	return userID, &req, true
+}
+
+// pathUUID parses the UUID at index of the URL path, sending a 400 response if it
+// is missing or malformed
+func pathUUID(w http.ResponseWriter, r *http.Request, index int, what string) (uuid.UUID, bool) {
+	parts := splitPath(r.URL.Path)
+	if len(parts) <= index {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(parts[index])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid "+what+" ID")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// respondWithAccountError sends the status of an account lifecycle error
+func respondWithAccountError(w http.ResponseWriter, err error, message string) {
+	var appErr *apperrors.AppError
+	if !errors.As(err, &appErr) {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", message)
+		return
+	}
+
+	status := http.StatusBadRequest
+	switch appErr.Code {
+	case "INVALID_MFA_CODE":
+		status = http.StatusUnauthorized
+	case "USER_DISABLED":
+		status = http.StatusForbidden
+	case "USERNAME_EXISTS", "EMAIL_EXISTS", "MFA_ALREADY_ENABLED":
+		status = http.StatusConflict
+	case "ACCOUNT_LOCKED":
+		status = http.StatusLocked
+	case "EMAIL_NOT_CONFIGURED":
+		status = http.StatusServiceUnavailable
+	}
+	respondWithError(w, status, appErr.Code, appErr.Message)
+}
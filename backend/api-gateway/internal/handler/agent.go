@@ -2,48 +2,108 @@
 package handler
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/wangjialin/myops/pkg/config"
+	"github.com/klauspost/compress/zstd"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
 	"github.com/wangjialin/myops/pkg/model"
 	"gorm.io/gorm"
 )
 
 // AgentHandler handles agent HTTP requests
 type AgentHandler struct {
-	db                *gorm.DB
-	autoApprovalConfig *config.AutoApprovalConfig
+	db       *gorm.DB
+	reports  *service.AgentReportService
+	commands *service.AgentCommandService
 }
 
 // NewAgentHandler creates a new AgentHandler
 func NewAgentHandler(db *gorm.DB) *AgentHandler {
 	return &AgentHandler{
-		db:                db,
-		autoApprovalConfig: config.DefaultAutoApprovalConfig(),
+		db:       db,
+		reports:  service.NewAgentReportService(db),
+		commands: service.NewAgentCommandService(db),
 	}
 }
 
+// Reports returns the service recording agent reports, which the gRPC agent
+// endpoint shares
+func (h *AgentHandler) Reports() *service.AgentReportService {
+	return h.reports
+}
+
+// Commands returns the service queueing agent commands
+func (h *AgentHandler) Commands() *service.AgentCommandService {
+	return h.commands
+}
+
+// SetHeartbeatService sets the service that brings silent hosts back online when
+// their agent reports again
+func (h *AgentHandler) SetHeartbeatService(heartbeats *service.HostHeartbeatService) {
+	h.reports.SetHeartbeatService(heartbeats)
+}
+
+// SetRemoteWriteService sets the service that pushes reported metrics to the
+// remote_write targets
+func (h *AgentHandler) SetRemoteWriteService(remoteWrite *service.RemoteWriteService) {
+	h.reports.SetRemoteWriteService(remoteWrite)
+}
+
+// SetHostAnomalyService sets the service that keeps the metric history host
+// anomaly rules are evaluated on
+func (h *AgentHandler) SetHostAnomalyService(anomalies *service.HostAnomalyService) {
+	h.reports.SetHostAnomalyService(anomalies)
+}
+
+// SetLifecycleService sets the service that activates provisioning hosts once
+// their agent reports
+func (h *AgentHandler) SetLifecycleService(lifecycle *service.HostLifecycleService) {
+	h.reports.SetLifecycleService(lifecycle)
+}
+
+// SetSharedAgentToken sets the token agents of hosts without their own token
+// authenticate with
+func (h *AgentHandler) SetSharedAgentToken(token string) {
+	h.reports.SetSharedAgentToken(token)
+}
+
+// SetPluginService sets the service that records plugin data and keeps the
+// agents' plugin sets current
+func (h *AgentHandler) SetPluginService(plugins *service.AgentPluginService) {
+	h.reports.SetPluginService(plugins)
+}
+
 // AgentReportRequest represents an agent report request
 type AgentReportRequest struct {
-	Hostname      string                 `json:"hostname"`
-	IPAddress     string                 `json:"ipAddress"`
-	MACAddress    string                 `json:"macAddress,omitempty"`
-	Gateway       string                 `json:"gateway,omitempty"`
-	OSType        string                 `json:"osType"`
-	OSVersion     string                 `json:"osVersion"`
-	KernelVersion string                 `json:"kernelVersion"`
-	Arch          string                 `json:"arch"`
-	CPUModel      string                 `json:"cpuModel,omitempty"`
-	CPUCores      int32                  `json:"cpuCores"`
-	MemoryTotal   uint64                 `json:"memoryTotal"` // bytes
-	Disks         []json.RawMessage      `json:"disks,omitempty"`
-	Networks      []json.RawMessage      `json:"networks,omitempty"`
-}
-
-// ServeHTTP handles HTTP requests for agent reporting
+	Hostname      string                   `json:"hostname"`
+	IPAddress     string                   `json:"ipAddress"`
+	MACAddress    string                   `json:"macAddress,omitempty"`
+	Gateway       string                   `json:"gateway,omitempty"`
+	OSType        string                   `json:"osType"`
+	OSVersion     string                   `json:"osVersion"`
+	KernelVersion string                   `json:"kernelVersion"`
+	Arch          string                   `json:"arch"`
+	CPUModel      string                   `json:"cpuModel,omitempty"`
+	CPUCores      int32                    `json:"cpuCores"`
+	MemoryTotal   uint64                   `json:"memoryTotal"` // bytes
+	Disks         []json.RawMessage        `json:"disks,omitempty"`
+	Networks      []json.RawMessage        `json:"networks,omitempty"`
+	Metrics       *model.HostMetricsReport `json:"metrics,omitempty"`
+
+	Plugins    map[string]model.AgentPluginOutput `json:"plugins,omitempty"`
+	PluginHash string                             `json:"pluginHash,omitempty"`
+}
+
+// ServeHTTP handles HTTP requests for agent reporting. Agents that cannot reach
+// the gRPC agent service fall back to this endpoint.
 func (h *AgentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -53,8 +113,7 @@ func (h *AgentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req AgentReportRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+	if !decodeAgentRequest(w, r, &req) {
 		return
 	}
 
@@ -64,129 +123,232 @@ func (h *AgentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Find existing host by IP address
-	var host model.Host
-	err := h.db.Where("ip_address = ?", req.IPAddress).First(&host).Error
+	report := req.agentReport()
+	report.Token = agentToken(r)
+	host, err := h.reports.Report(report)
+	if err != nil {
+		respondWithAgentError(w, err, "Failed to record report")
+		return
+	}
 
-	now := time.Now()
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": map[string]interface{}{
+			"success": true,
+			"hostId":  host.ID,
+			"status":  string(host.Status),
+			"message": "Report received successfully",
+		},
+		"requestId": responseRequestID(w),
+	})
+}
 
-	if err == gorm.ErrRecordNotFound {
-		// Create labels first (needed for auto-approval check)
-		labels := make(model.LabelMap)
-		if req.Arch != "" {
-			labels["arch"] = req.Arch
-		}
-		if req.KernelVersion != "" {
-			labels["kernel_version"] = req.KernelVersion
-		}
-		if req.CPUModel != "" {
-			labels["cpu_model"] = req.CPUModel
-		}
+// maxAgentReportBatch is the most reports an agent may send in one batch
+const maxAgentReportBatch = 100
 
-		// Determine status based on auto-approval rules
-		status := model.HostStatusPending // Default to pending
-		if h.autoApprovalConfig.ShouldAutoApprove(req.IPAddress, labels) {
-			status = model.HostStatusApproved
-		}
+// AgentReportBatchRequest represents the reports an agent buffered while the
+// gateway was unreachable, oldest first
+type AgentReportBatchRequest struct {
+	Reports []AgentBatchedReport `json:"reports"`
+}
 
-		// Create new host
-		host = model.Host{
-			ID:        uuid.New(),
-			Hostname:  req.Hostname,
-			IPAddress: req.IPAddress,
-			Port:      22,
-			Status:    status,
-			OSType:    req.OSType,
-			OSVersion: req.OSVersion,
-			LastSeenAt: &now,
-			Labels:    labels,
-		}
+// AgentBatchedReport is a buffered report and when the agent sampled it
+type AgentBatchedReport struct {
+	AgentReportRequest
+	CollectedAt time.Time `json:"collectedAt"`
+}
 
-		// Set CPU cores if provided
-		if req.CPUCores > 0 {
-			cores := int(req.CPUCores)
-			host.CPUCores = &cores
+// ReportBatch records a batch of buffered reports in order. The batch is refused
+// as a whole when a report is invalid or the host has been rejected.
+func (h *AgentHandler) ReportBatch(w http.ResponseWriter, r *http.Request) {
+	var req AgentReportBatchRequest
+	if !decodeAgentRequest(w, r, &req) {
+		return
+	}
+	if len(req.Reports) == 0 || len(req.Reports) > maxAgentReportBatch {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST",
+			fmt.Sprintf("A batch must hold between 1 and %d reports", maxAgentReportBatch))
+		return
+	}
+	for _, report := range req.Reports {
+		if report.IPAddress == "" {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "IP address is required")
+			return
 		}
+	}
 
-		// Set memory in GB
-		if req.MemoryTotal > 0 {
-			memGB := int(req.MemoryTotal / (1024 * 1024 * 1024))
-			host.MemoryGB = &memGB
-		}
+	var host *model.Host
+	for _, batched := range req.Reports {
+		report := batched.agentReport()
+		report.Token = agentToken(r)
+		report.CollectedAt = batched.CollectedAt
 
-		if err := h.db.Create(&host).Error; err != nil {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create host")
-			return
-		}
-	} else if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
-		return
-	} else {
-		// Check if host is rejected
-		if host.Status == model.HostStatusRejected {
-			respondWithError(w, http.StatusForbidden, "HOST_REJECTED", "Host has been rejected and cannot report")
+		var err error
+		host, err = h.reports.Report(report)
+		if err != nil {
+			respondWithAgentError(w, err, "Failed to record report")
 			return
 		}
+	}
 
-		// Update existing host
-		updates := map[string]interface{}{
-			"last_seen_at": now,
-		}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"hostId":   host.ID,
+		"status":   string(host.Status),
+		"accepted": len(req.Reports),
+		"message":  "Reports received successfully",
+	})
+}
 
-		if req.Hostname != "" {
-			updates["hostname"] = req.Hostname
-		}
-		if req.OSType != "" {
-			updates["os_type"] = req.OSType
-		}
-		if req.OSVersion != "" {
-			updates["os_version"] = req.OSVersion
+// agentReport converts the request to the form the report service records
+func (req *AgentReportRequest) agentReport() *service.AgentReport {
+	disks := make([]model.HostDiskUsage, 0, len(req.Disks))
+	for _, raw := range req.Disks {
+		var disk model.HostDiskUsage
+		if json.Unmarshal(raw, &disk) == nil {
+			disks = append(disks, disk)
 		}
+	}
 
-		// Update CPU cores if provided
-		if req.CPUCores > 0 {
-			cores := int(req.CPUCores)
-			updates["cpu_cores"] = cores
-		}
+	return &service.AgentReport{
+		Hostname:      req.Hostname,
+		IPAddress:     req.IPAddress,
+		OSType:        req.OSType,
+		OSVersion:     req.OSVersion,
+		KernelVersion: req.KernelVersion,
+		Arch:          req.Arch,
+		CPUModel:      req.CPUModel,
+		CPUCores:      req.CPUCores,
+		MemoryTotal:   req.MemoryTotal,
+		Disks:         disks,
+		Metrics:       req.Metrics,
+		Plugins:       req.Plugins,
+		PluginHash:    req.PluginHash,
+	}
+}
 
-		// Update memory if provided
-		if req.MemoryTotal > 0 {
-			memGB := int(req.MemoryTotal / (1024 * 1024 * 1024))
-			updates["memory_gb"] = memGB
-		}
+// maxAgentRequestSize bounds an agent request body once decompressed
+const maxAgentRequestSize = 32 << 20
 
-		// Update labels with additional info
-		host.Labels = make(model.LabelMap)
-		if req.Arch != "" {
-			host.Labels["arch"] = req.Arch
+// decodeAgentRequest decodes an agent's JSON body into v, which agents may compress
+// with gzip or zstd. It sends 400 when the body cannot be read.
+func decodeAgentRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	var body io.Reader = r.Body
+	switch encoding := strings.ToLower(r.Header.Get("Content-Encoding")); encoding {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid gzip body")
+			return false
 		}
-		if req.KernelVersion != "" {
-			host.Labels["kernel_version"] = req.KernelVersion
+		defer gz.Close()
+		body = gz
+	case "zstd":
+		zr, err := zstd.NewReader(r.Body)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid zstd body")
+			return false
 		}
-		if req.CPUModel != "" {
-			host.Labels["cpu_model"] = req.CPUModel
-		}
-		updates["labels"] = host.Labels
+		defer zr.Close()
+		body = zr
+	default:
+		respondWithError(w, http.StatusUnsupportedMediaType, "UNSUPPORTED_ENCODING",
+			fmt.Sprintf("Unsupported content encoding %q", encoding))
+		return false
+	}
 
-		// Update status to online if was approved
-		if host.Status == model.HostStatusApproved {
-			updates["status"] = model.HostStatusOnline
-		}
+	if err := json.NewDecoder(io.LimitReader(body, maxAgentRequestSize)).Decode(v); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return false
+	}
+	return true
+}
 
-		if err := h.db.Model(&host).Updates(updates).Error; err != nil {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update host")
-			return
-		}
+// AgentCommandResultRequest represents a command result posted by an agent
+type AgentCommandResultRequest struct {
+	HostID uuid.UUID `json:"hostId"`
+	model.AgentCommandResult
+}
+
+// PollCommands returns the commands queued for the polling agent's host
+func (h *AgentHandler) PollCommands(w http.ResponseWriter, r *http.Request) {
+	hostID, err := uuid.Parse(r.URL.Query().Get("hostId"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_HOST_ID", "Invalid host ID")
+		return
+	}
+
+	if _, err := h.reports.AuthorizeAgent(agentToken(r), hostID); err != nil {
+		respondWithAgentError(w, err, "Internal server error")
+		return
+	}
+
+	commands, err := h.commands.Poll(hostID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to poll commands")
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"data": map[string]interface{}{
-			"success":   true,
-			"hostId":    host.ID,
-			"status":    string(host.Status),
-			"message":   "Report received successfully",
-		},
-		"requestId": generateRequestID(),
+		"data":      commands,
+		"requestId": responseRequestID(w),
 	})
 }
+
+// SubmitCommandResult records the result of a command executed by an agent
+func (h *AgentHandler) SubmitCommandResult(w http.ResponseWriter, r *http.Request) {
+	// Get command ID from URL path (/api/v1/agent/commands/{id}/result)
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) != 6 || pathParts[5] != "result" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+
+	commandID, err := uuid.Parse(pathParts[4])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_COMMAND_ID", "Invalid command ID")
+		return
+	}
+
+	var req AgentCommandResultRequest
+	if !decodeAgentRequest(w, r, &req) {
+		return
+	}
+	if _, err := h.reports.AuthorizeAgent(agentToken(r), req.HostID); err != nil {
+		respondWithAgentError(w, err, "Failed to record result")
+		return
+	}
+
+	if err := h.commands.Complete(req.HostID, commandID, &req.AgentCommandResult); err == gorm.ErrRecordNotFound {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Command not found or already finished")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to record result")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Result recorded",
+	})
+}
+
+// agentToken returns the agent token a request was sent with
+func agentToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// respondWithAgentError sends the status of an agent report or authorization error
+func respondWithAgentError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrAgentTokenInvalid), errors.Is(err, service.ErrAgentTokenRevoked):
+		respondWithError(w, http.StatusUnauthorized, "INVALID_AGENT_TOKEN", err.Error())
+	case errors.Is(err, service.ErrAgentHostNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Host not found")
+	case errors.Is(err, service.ErrAgentHostRejected):
+		respondWithError(w, http.StatusForbidden, "HOST_REJECTED", "Host has been rejected or decommissioned")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
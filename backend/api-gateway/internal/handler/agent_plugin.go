@@ -0,0 +1,190 @@
+// Package handler provides HTTP handlers for agent plugins
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// AgentPluginHandler handles agent plugin operations
+type AgentPluginHandler struct {
+	db      *gorm.DB
+	plugins *service.AgentPluginService
+}
+
+// NewAgentPluginHandler creates a new agent plugin handler
+func NewAgentPluginHandler(db *gorm.DB, plugins *service.AgentPluginService) *AgentPluginHandler {
+	return &AgentPluginHandler{db: db, plugins: plugins}
+}
+
+// ListPlugins lists the agent plugins (GET /api/v1/agent-plugins)
+func (h *AgentPluginHandler) ListPlugins(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "list", nil, "") {
+		return
+	}
+
+	plugins, err := h.plugins.List()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list agent plugins")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  plugins,
+		"total": len(plugins),
+	})
+}
+
+// GetPlugin gets one agent plugin (GET /api/v1/agent-plugins/{id})
+func (h *AgentPluginHandler) GetPlugin(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "list", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "plugin")
+	if !ok {
+		return
+	}
+
+	plugin, err := h.plugins.Get(id)
+	if err != nil {
+		respondWithAgentPluginError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, plugin)
+}
+
+// CreatePlugin creates an agent plugin and pushes it to the hosts it runs on
+// (POST /api/v1/agent-plugins)
+func (h *AgentPluginHandler) CreatePlugin(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "plugins", nil, "") {
+		return
+	}
+
+	var req model.CreateAgentPluginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	plugin, err := h.plugins.Create(&req, userID)
+	if err != nil {
+		respondWithAgentPluginError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, plugin)
+}
+
+// UpdatePlugin changes an agent plugin (PUT /api/v1/agent-plugins/{id})
+func (h *AgentPluginHandler) UpdatePlugin(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "plugins", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "plugin")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateAgentPluginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	plugin, err := h.plugins.Update(id, &req)
+	if err != nil {
+		respondWithAgentPluginError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, plugin)
+}
+
+// DeletePlugin removes an agent plugin from every host (DELETE /api/v1/agent-plugins/{id})
+func (h *AgentPluginHandler) DeletePlugin(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "plugins", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "plugin")
+	if !ok {
+		return
+	}
+
+	if err := h.plugins.Delete(id); err != nil {
+		respondWithAgentPluginError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Agent plugin deleted successfully",
+	})
+}
+
+// GetHostPluginData returns the latest data each plugin reported for a host
+// (GET /api/v1/hosts/{id}/plugins)
+func (h *AgentPluginHandler) GetHostPluginData(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "get", nil, "") {
+		return
+	}
+	hostID, ok := pathUUID(w, r, 3, "host")
+	if !ok {
+		return
+	}
+
+	var host model.Host
+	if err := h.db.Where("id = ?", hostID).First(&host).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Host not found")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch host")
+		return
+	}
+
+	data, err := h.plugins.HostData(host.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch plugin data")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  data,
+		"total": len(data),
+	})
+}
+
+func respondWithAgentPluginError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrAgentPluginNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Agent plugin not found")
+	case errors.Is(err, service.ErrAgentPluginExists):
+		respondWithError(w, http.StatusConflict, "CONFLICT", err.Error())
+	case errors.Is(err, service.ErrInvalidAgentPlugin):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update agent plugin")
+	}
+}
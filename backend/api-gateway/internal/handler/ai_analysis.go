@@ -2,25 +2,75 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/db"
 	"github.com/wangjialin/myops/pkg/model"
 	"gorm.io/gorm"
 )
 
+// llmHistoryLimit is the number of most recent messages sent to the LLM with each reply
+const llmHistoryLimit = 20
+
+// llmContextTimeout bounds gathering cluster context for a message
+const llmContextTimeout = 15 * time.Second
+
 // AIAnalysisHandler handles AI analysis operations
 type AIAnalysisHandler struct {
-	db *gorm.DB
+	db       *gorm.DB
+	contexts *service.LLMContextBuilder
+	tools    *service.LLMToolExecutor
+	llm      *service.LLMClient
+	events   *service.EventBus
+	flags    *service.FeatureFlagService
+	usage    *service.LLMUsageService
+
+	hostAnomalies *service.HostAnomalyService
 }
 
 // NewAIAnalysisHandler creates a new AI analysis handler
 func NewAIAnalysisHandler(db *gorm.DB) *AIAnalysisHandler {
-	return &AIAnalysisHandler{db: db}
+	return &AIAnalysisHandler{
+		db:       db,
+		contexts: service.NewLLMContextBuilder(db),
+		tools:    service.NewLLMToolExecutor(db),
+	}
+}
+
+// SetLLMClient sets the client used to answer conversation messages. Without one,
+// replies are placeholders.
+func (h *AIAnalysisHandler) SetLLMClient(client *service.LLMClient) {
+	h.llm = client
+}
+
+// SetEventBus sets the bus detected anomalies are published on
+func (h *AIAnalysisHandler) SetEventBus(events *service.EventBus) {
+	h.events = events
+}
+
+// SetFeatureFlags sets the flags that gate anomaly detection and assistant tool calling
+func (h *AIAnalysisHandler) SetFeatureFlags(flags *service.FeatureFlagService) {
+	h.flags = flags
+}
+
+// SetLLMUsage sets the service that prices replies and reports LLM usage
+func (h *AIAnalysisHandler) SetLLMUsage(usage *service.LLMUsageService) {
+	h.usage = usage
+}
+
+// SetHostAnomalyService sets the service that evaluates rules on host metrics.
+// Without one, host rules cannot be run.
+func (h *AIAnalysisHandler) SetHostAnomalyService(hostAnomalies *service.HostAnomalyService) {
+	h.hostAnomalies = hostAnomalies
 }
 
 // ============== Anomaly Detection Rules ==============
@@ -52,6 +102,21 @@ func (h *AIAnalysisHandler) CreateAnomalyRule(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if req.SourceType == "" {
+		req.SourceType = model.AnomalySourcePrometheus
+	}
+	switch req.SourceType {
+	case model.AnomalySourcePrometheus:
+		if req.MetricQuery == "" {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "metricQuery is required")
+			return
+		}
+	case model.AnomalySourceHost:
+	default:
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "sourceType must be prometheus or host")
+		return
+	}
+
 	// Verify cluster ownership if provided
 	if req.ClusterID != nil {
 		var cluster model.K8sCluster
@@ -92,7 +157,10 @@ func (h *AIAnalysisHandler) CreateAnomalyRule(w http.ResponseWriter, r *http.Req
 		DataSourceID:       req.DataSourceID,
 		Name:               req.Name,
 		Description:        req.Description,
+		SourceType:         req.SourceType,
 		MetricQuery:        req.MetricQuery,
+		HostMetric:         req.HostMetric,
+		HostTags:           req.HostTags,
 		Algorithm:          req.Algorithm,
 		Sensitivity:        req.Sensitivity,
 		WindowSize:         req.WindowSize,
@@ -117,6 +185,12 @@ func (h *AIAnalysisHandler) CreateAnomalyRule(w http.ResponseWriter, r *http.Req
 	if rule.AlertThreshold == 0 {
 		rule.AlertThreshold = 0.8
 	}
+	if rule.SourceType == model.AnomalySourceHost {
+		if err := service.ValidateHostRule(&rule); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+			return
+		}
+	}
 
 	if err := h.db.Create(&rule).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create anomaly detection rule")
@@ -317,6 +391,12 @@ func (h *AIAnalysisHandler) UpdateAnomalyRule(w http.ResponseWriter, r *http.Req
 	if req.MetricQuery != nil {
 		updates["metric_query"] = *req.MetricQuery
 	}
+	if req.HostMetric != nil {
+		updates["host_metric"] = *req.HostMetric
+	}
+	if req.HostTags != nil {
+		updates["host_tags"] = pq.StringArray(*req.HostTags)
+	}
 	if req.Algorithm != nil {
 		updates["algorithm"] = *req.Algorithm
 	}
@@ -348,6 +428,24 @@ func (h *AIAnalysisHandler) UpdateAnomalyRule(w http.ResponseWriter, r *http.Req
 		updates["notification_channels"] = *req.NotificationChannels
 	}
 
+	// Host rules are checked as they will be after the update
+	if rule.SourceType == model.AnomalySourceHost {
+		updated := rule
+		if req.HostMetric != nil {
+			updated.HostMetric = *req.HostMetric
+		}
+		if req.Algorithm != nil {
+			updated.Algorithm = *req.Algorithm
+		}
+		if req.WindowSize != nil {
+			updated.WindowSize = *req.WindowSize
+		}
+		if err := service.ValidateHostRule(&updated); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+			return
+		}
+	}
+
 	if err := h.db.Model(&rule).Updates(updates).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update anomaly detection rule")
 		return
@@ -442,6 +540,9 @@ func (h *AIAnalysisHandler) ExecuteAnomalyDetection(w http.ResponseWriter, r *ht
 		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
 		return
 	}
+	if !requireFeature(w, h.flags, userUUID, model.FeatureAnomalyDetection) {
+		return
+	}
 
 	// Fetch rule
 	var rule model.AnomalyDetectionRule
@@ -456,6 +557,29 @@ func (h *AIAnalysisHandler) ExecuteAnomalyDetection(w http.ResponseWriter, r *ht
 
 	startTime := time.Now()
 
+	// Host rules are evaluated on the metrics agents report
+	if rule.SourceType == model.AnomalySourceHost {
+		if h.hostAnomalies == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Host anomaly detection not available")
+			return
+		}
+		anomalies, err := h.hostAnomalies.Evaluate(r.Context(), &rule)
+		if errors.Is(err, service.ErrInvalidAnomalyRule) {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+			return
+		} else if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to evaluate anomaly detection rule")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, model.ExecuteAnomalyDetectionResponse{
+			Anomalies:    anomalies,
+			AnomalyCount: len(anomalies),
+			EvaluatedAt:  time.Now(),
+			Duration:     time.Since(startTime).Milliseconds(),
+		})
+		return
+	}
+
 	// TODO: Implement actual anomaly detection
 	// This would:
 	// 1. Query metrics from Prometheus based on rule.MetricQuery
@@ -480,6 +604,19 @@ func (h *AIAnalysisHandler) ExecuteAnomalyDetection(w http.ResponseWriter, r *ht
 		Duration:     duration,
 	}
 
+	for i := range response.Anomalies {
+		anomaly := &response.Anomalies[i]
+		attrs := map[string]string{
+			"anomalyId": anomaly.ID.String(),
+			"ruleId":    anomaly.RuleID.String(),
+			"severity":  anomaly.Severity,
+		}
+		if anomaly.ClusterID != nil {
+			attrs["clusterId"] = anomaly.ClusterID.String()
+		}
+		h.events.Publish(userUUID, model.EventAnomalyDetected, attrs, anomaly)
+	}
+
 	respondWithJSON(w, http.StatusOK, response)
 }
 
@@ -536,6 +673,12 @@ func (h *AIAnalysisHandler) ListAnomalyEvents(w http.ResponseWriter, r *http.Req
 			query = query.Where("rule_id = ?", ruleUUID)
 		}
 	}
+	if hostID := r.URL.Query().Get("hostId"); hostID != "" {
+		hostUUID, err := uuid.Parse(hostID)
+		if err == nil {
+			query = query.Where("host_id = ?", hostUUID)
+		}
+	}
 	if severity := r.URL.Query().Get("severity"); severity != "" {
 		query = query.Where("severity = ?", severity)
 	}
@@ -550,7 +693,7 @@ func (h *AIAnalysisHandler) ListAnomalyEvents(w http.ResponseWriter, r *http.Req
 	// Fetch events
 	var events []model.AnomalyEvent
 	offset := (page - 1) * pageSize
-	if err := query.Preload("Rule").Preload("Cluster").Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&events).Error; err != nil {
+	if err := query.Preload("Rule").Preload("Cluster").Preload("Host").Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&events).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch anomaly events")
 		return
 	}
@@ -564,6 +707,46 @@ func (h *AIAnalysisHandler) ListAnomalyEvents(w http.ResponseWriter, r *http.Req
 	})
 }
 
+// ListHostAnomalies lists the anomalies host rules detected on a host, newest
+// first, for the host's page
+func (h *AIAnalysisHandler) ListHostAnomalies(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "get", nil, "") {
+		return
+	}
+	hostID, ok := pathUUID(w, r, 3, "host")
+	if !ok {
+		return
+	}
+	if h.hostAnomalies == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Host anomaly detection not available")
+		return
+	}
+
+	var host model.Host
+	if err := h.db.Select("id").Where("id = ?", hostID).First(&host).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Host not found")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch host")
+		return
+	}
+
+	_, limit := pageParams(r)
+	events, err := h.hostAnomalies.HostEvents(host.ID, r.URL.Query().Get("status"), limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch anomaly events")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  events,
+		"total": len(events),
+	})
+}
+
 // ============== LLM Conversations ==============
 
 // CreateLLMConversation creates a new LLM conversation
@@ -786,11 +969,10 @@ func (h *AIAnalysisHandler) DeleteLLMConversation(w http.ResponseWriter, r *http
 		return
 	}
 
-	// Delete messages first
-	h.db.Where("conversation_id = ?", conversationUUID).Delete(&model.LLMMessage{})
-
-	// Delete conversation
-	if err := h.db.Delete(&conversation).Error; err != nil {
+	// Delete the conversation with its messages, context snapshots and tool calls
+	err = db.DeleteWithChildren(h.db, &conversation, "conversation_id", conversationUUID,
+		&model.LLMMessage{}, &model.LLMContextSnapshot{}, &model.LLMToolInvocation{})
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete conversation")
 		return
 	}
@@ -800,6 +982,102 @@ func (h *AIAnalysisHandler) DeleteLLMConversation(w http.ResponseWriter, r *http
 	})
 }
 
+// GetLLMContextSnapshot returns the cluster context that was injected for a reply
+func (h *AIAnalysisHandler) GetLLMContextSnapshot(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path)
+	if len(parts) != 7 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+	conversationUUID, err := uuid.Parse(parts[4])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid conversation ID format")
+		return
+	}
+	snapshotUUID, err := uuid.Parse(parts[6])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid snapshot ID format")
+		return
+	}
+
+	userUUID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var conversation model.LLMConversation
+	if err := h.db.Where("id = ? AND user_id = ?", conversationUUID, userUUID).First(&conversation).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Conversation not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch conversation")
+		}
+		return
+	}
+
+	var snapshot model.LLMContextSnapshot
+	if err := h.db.Where("id = ? AND conversation_id = ?", snapshotUUID, conversationUUID).First(&snapshot).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Context snapshot not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch context snapshot")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, snapshot)
+}
+
+// ListLLMToolInvocations lists the tool calls made while answering a conversation
+func (h *AIAnalysisHandler) ListLLMToolInvocations(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path)
+	if len(parts) != 6 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+	conversationUUID, err := uuid.Parse(parts[4])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid conversation ID format")
+		return
+	}
+
+	userUUID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var conversation model.LLMConversation
+	if err := h.db.Where("id = ? AND user_id = ?", conversationUUID, userUUID).First(&conversation).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Conversation not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch conversation")
+		}
+		return
+	}
+
+	query := h.db.Where("conversation_id = ?", conversationUUID)
+	if messageID := r.URL.Query().Get("messageId"); messageID != "" {
+		messageUUID, err := uuid.Parse(messageID)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid message ID format")
+			return
+		}
+		query = query.Where("message_id = ?", messageUUID)
+	}
+
+	var invocations []model.LLMToolInvocation
+	if err := query.Order("created_at").Find(&invocations).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch tool invocations")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"invocations": invocations,
+		"total":       len(invocations),
+	})
+}
+
 // SendLLMMessage sends a message in an LLM conversation
 func (h *AIAnalysisHandler) SendLLMMessage(w http.ResponseWriter, r *http.Request) {
 	// Extract conversation ID from URL path
@@ -852,6 +1130,27 @@ func (h *AIAnalysisHandler) SendLLMMessage(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Tokens are counted from the replies, so a reply may overshoot the budget but
+	// none is requested once a hard budget is used up; a soft one only warns
+	var budgetWarning string
+	if h.llm != nil {
+		if budgetWarning, ok = checkQuota(w, userUUID, model.QuotaResourceLLMTokens, 1); !ok {
+			return
+		}
+	}
+
+	// Gather cluster context for this reply; the reply still goes ahead without it
+	var snapshot *model.LLMContextSnapshot
+	if !req.DisableContext {
+		ctx, cancel := context.WithTimeout(r.Context(), llmContextTimeout)
+		snapshot, err = h.contexts.Build(ctx, &conversation, req.ContextSections, req.ContextBudget)
+		cancel()
+		if errors.Is(err, service.ErrUnknownContextSection) {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+			return
+		}
+	}
+
 	// Create user message
 	userMessage := model.LLMMessage{
 		ConversationID: conversationUUID,
@@ -864,33 +1163,81 @@ func (h *AIAnalysisHandler) SendLLMMessage(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// TODO: Implement actual LLM API call
-	// This would:
-	// 1. Get conversation history
-	// 2. Call LLM API (OpenAI, Anthropic, etc.)
-	// 3. Parse response and create assistant message
-
-	startTime := time.Now()
-	duration := time.Since(startTime).Milliseconds()
+	var history []model.LLMMessage
+	h.db.Where("conversation_id = ?", conversationUUID).Order("created_at DESC").Limit(llmHistoryLimit).Find(&history)
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	prompt := service.BuildLLMPrompt(&conversation, history, snapshot)
 
-	// Create assistant message (simulated for now)
 	assistantMessage := model.LLMMessage{
 		ConversationID: conversationUUID,
 		Role:           "assistant",
 		Content:        "This is a simulated response. The LLM integration is not yet implemented. Please configure your LLM API credentials in the settings.",
 		TokensUsed:     50,
 	}
+	if snapshot != nil {
+		assistantMessage.ContextSnapshotID = &snapshot.ID
+	}
+	var invocations []model.LLMToolInvocation
+	if h.llm != nil {
+		var completion *service.LLMCompletion
+		if req.DisableTools || !h.flags.IsEnabled(userUUID, model.FeatureAITools) {
+			completion, err = h.llm.Chat(r.Context(), conversation.Model, conversation.Temperature, conversation.MaxTokens, prompt, nil)
+		} else {
+			username, _ := r.Context().Value("username").(string)
+			caller := &service.LLMToolCaller{
+				UserID:         userUUID,
+				Username:       username,
+				IPAddress:      r.RemoteAddr,
+				ConversationID: conversationUUID,
+				ClusterID:      conversation.ClusterID,
+			}
+			completion, invocations, err = h.tools.Converse(r.Context(), h.llm, &conversation, prompt, caller)
+		}
+		if err != nil {
+			respondWithError(w, http.StatusBadGateway, "LLM_ERROR", err.Error())
+			return
+		}
+		assistantMessage.Content = completion.Content
+		assistantMessage.TokensUsed = completion.TokensUsed
+		assistantMessage.PromptTokens = completion.PromptTokens
+		assistantMessage.CompletionTokens = completion.CompletionTokens
+		assistantMessage.Model = completion.Model
+		if assistantMessage.Model == "" {
+			assistantMessage.Model = conversation.Model
+		}
+		if h.usage != nil {
+			assistantMessage.Cost = h.usage.Cost(assistantMessage.Model, completion.PromptTokens, completion.CompletionTokens, completion.TokensUsed)
+		}
+	}
 
 	if err := h.db.Create(&assistantMessage).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create assistant message")
 		return
 	}
 
+	// Link the tool calls to the reply they contributed to
+	if len(invocations) > 0 {
+		ids := make([]uuid.UUID, len(invocations))
+		for i := range invocations {
+			ids[i] = invocations[i].ID
+			invocations[i].MessageID = &assistantMessage.ID
+		}
+		h.db.Model(&model.LLMToolInvocation{}).Where("id IN ?", ids).Update("message_id", assistantMessage.ID)
+	}
+
 	response := model.SendLLMMessageResponse{
 		MessageID: assistantMessage.ID.String(),
 		Content:   assistantMessage.Content,
 		TokensUsed: assistantMessage.TokensUsed,
+		Cost:      assistantMessage.Cost,
+		BudgetWarning: budgetWarning,
+	}
+	if snapshot != nil {
+		response.ContextSnapshotID = snapshot.ID.String()
 	}
+	response.ToolInvocations = invocations
 
 	respondWithJSON(w, http.StatusOK, response)
 }
@@ -3,73 +3,57 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/db"
 	"github.com/wangjialin/myops/pkg/model"
 	"gorm.io/gorm"
 )
 
 // AlertHandler handles alert operations
 type AlertHandler struct {
-	db *gorm.DB
+	db    *gorm.DB
+	rules *service.AlertRuleService
 }
 
 // NewAlertHandler creates a new alert handler
-func NewAlertHandler(db *gorm.DB) *AlertHandler {
-	return &AlertHandler{db: db}
+func NewAlertHandler(db *gorm.DB, rules *service.AlertRuleService) *AlertHandler {
+	return &AlertHandler{db: db, rules: rules}
 }
 
 // ListAlertRules handles alert rule list requests
 func (h *AlertHandler) ListAlertRules(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	var userID uuid.UUID
-	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
-		if uid, ok := userIDVal.(string); ok {
-			userID, _ = uuid.Parse(uid)
-		}
-	}
-
-	if userID == (uuid.UUID{}) {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// Parse query parameters
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page < 1 {
-		page = 1
-	}
-	pageSize, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 20
+	tags, ok := tagSelectorParam(w, r)
+	if !ok {
+		return
 	}
 
-	// Build query
-	query := h.db.Model(&model.AlertRule{}).Where("user_id = ?", userID)
-
-	if enabled := r.URL.Query().Get("enabled"); enabled != "" {
-		if enabled == "true" {
-			query = query.Where("enabled = ?", true)
-		} else if enabled == "false" {
-			query = query.Where("enabled = ?", false)
-		}
+	page, pageSize := pageParams(r)
+	query := r.URL.Query()
+	filter := &db.AlertRuleFilter{
+		UserID:     userID,
+		TargetType: query.Get("targetType"),
+		Tags:       tags,
+		Page:       page,
+		PageSize:   pageSize,
 	}
-
-	if targetType := r.URL.Query().Get("targetType"); targetType != "" {
-		query = query.Where("target_type = ?", targetType)
+	if enabled := query.Get("enabled"); enabled == "true" || enabled == "false" {
+		on := enabled == "true"
+		filter.Enabled = &on
 	}
 
-	// Get total count
-	var total int64
-	query.Count(&total)
-
-	// Get rules with pagination
-	var rules []model.AlertRule
-	offset := (page - 1) * pageSize
-	if err := query.Order("created_at DESC").Limit(pageSize).Offset(offset).Find(&rules).Error; err != nil {
+	rules, total, err := h.rules.List(r.Context(), filter)
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve alert rules")
 		return
 	}
@@ -86,37 +70,18 @@ func (h *AlertHandler) ListAlertRules(w http.ResponseWriter, r *http.Request) {
 
 // CreateAlertRule handles alert rule creation requests
 func (h *AlertHandler) CreateAlertRule(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
-		return
-	}
-
 	var req model.AlertRule
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
 		return
 	}
 
-	// Get user ID from context
-	var userID uuid.UUID
-	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
-		if uid, ok := userIDVal.(string); ok {
-			userID, _ = uuid.Parse(uid)
-		}
-	}
-
-	if userID == (uuid.UUID{}) {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// Set user ID and generate ID
-	req.ID = uuid.New()
-	req.UserID = userID
-	req.CreatedAt = time.Now()
-	req.UpdatedAt = time.Now()
-
-	if err := h.db.Create(&req).Error; err != nil {
+	if err := h.rules.Create(r.Context(), userID, &req); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create alert rule")
 		return
 	}
@@ -128,36 +93,18 @@ func (h *AlertHandler) CreateAlertRule(w http.ResponseWriter, r *http.Request) {
 
 // GetAlertRule handles alert rule retrieval requests
 func (h *AlertHandler) GetAlertRule(w http.ResponseWriter, r *http.Request) {
-	// Get rule ID from URL path
-	pathParts := splitPath(r.URL.Path)
-	if len(pathParts) < 4 || pathParts[3] != "alert-rules" {
-		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+	ruleID, ok := pathUUID(w, r, 3, "rule")
+	if !ok {
 		return
 	}
-
-	ruleID, err := uuid.Parse(pathParts[4])
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_RULE_ID", "Invalid rule ID")
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// Get user ID from context
-	var userID uuid.UUID
-	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
-		if uid, ok := userIDVal.(string); ok {
-			userID, _ = uuid.Parse(uid)
-		}
-	}
-
-	if userID == (uuid.UUID{}) {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	// Get rule
-	var rule model.AlertRule
-	if err := h.db.Where("id = ? AND user_id = ?", ruleID, userID).First(&rule).Error; err != nil {
-		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert rule not found")
+	rule, err := h.rules.Get(r.Context(), ruleID, userID)
+	if err != nil {
+		respondWithAlertRuleError(w, err, "Failed to retrieve alert rule")
 		return
 	}
 
@@ -168,21 +115,8 @@ func (h *AlertHandler) GetAlertRule(w http.ResponseWriter, r *http.Request) {
 
 // UpdateAlertRule handles alert rule update requests
 func (h *AlertHandler) UpdateAlertRule(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
-		respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
-		return
-	}
-
-	// Get rule ID from URL path
-	pathParts := splitPath(r.URL.Path)
-	if len(pathParts) < 4 || pathParts[3] != "alert-rules" {
-		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
-		return
-	}
-
-	ruleID, err := uuid.Parse(pathParts[4])
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_RULE_ID", "Invalid rule ID")
+	ruleID, ok := pathUUID(w, r, 3, "rule")
+	if !ok {
 		return
 	}
 
@@ -192,70 +126,17 @@ func (h *AlertHandler) UpdateAlertRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user ID from context
-	var userID uuid.UUID
-	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
-		if uid, ok := userIDVal.(string); ok {
-			userID, _ = uuid.Parse(uid)
-		}
-	}
-
-	if userID == (uuid.UUID{}) {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	// Get rule
-	var rule model.AlertRule
-	if err := h.db.Where("id = ? AND user_id = ?", ruleID, userID).First(&rule).Error; err != nil {
-		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert rule not found")
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// Update fields
-	updates := make(map[string]interface{})
-	if req.Name != "" {
-		updates["name"] = req.Name
-	}
-	if req.Description != "" {
-		updates["description"] = req.Description
-	}
-	if req.TargetType != "" {
-		updates["target_type"] = req.TargetType
-	}
-	if req.TargetID != "" {
-		updates["target_id"] = req.TargetID
-	}
-	if req.MetricType != "" {
-		updates["metric_type"] = req.MetricType
-	}
-	if req.Operator != "" {
-		updates["operator"] = req.Operator
-	}
-	if req.Threshold != 0 {
-		updates["threshold"] = req.Threshold
-	}
-	if req.Duration != 0 {
-		updates["duration"] = req.Duration
-	}
-	if req.Severity != "" {
-		updates["severity"] = req.Severity
-	}
-	updates["notify_email"] = req.NotifyEmail
-	updates["notify_webhook"] = req.NotifyWebhook
-	if req.WebhookURL != "" {
-		updates["webhook_url"] = req.WebhookURL
-	}
-	updates["updated_at"] = time.Now()
-
-	if err := h.db.Model(&rule).Updates(updates).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update alert rule")
+	rule, err := h.rules.Update(r.Context(), ruleID, userID, &req)
+	if err != nil {
+		respondWithAlertRuleError(w, err, "Failed to update alert rule")
 		return
 	}
 
-	// Get updated rule
-	h.db.Where("id = ?", ruleID).First(&rule)
-
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"data": rule,
 	})
@@ -263,50 +144,17 @@ func (h *AlertHandler) UpdateAlertRule(w http.ResponseWriter, r *http.Request) {
 
 // DeleteAlertRule handles alert rule deletion requests
 func (h *AlertHandler) DeleteAlertRule(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
-		return
-	}
-
-	// Get rule ID from URL path
-	pathParts := splitPath(r.URL.Path)
-	if len(pathParts) < 4 || pathParts[3] != "alert-rules" {
-		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
-		return
-	}
-
-	ruleID, err := uuid.Parse(pathParts[4])
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_RULE_ID", "Invalid rule ID")
-		return
-	}
-
-	// Get user ID from context
-	var userID uuid.UUID
-	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
-		if uid, ok := userIDVal.(string); ok {
-			userID, _ = uuid.Parse(uid)
-		}
-	}
-
-	if userID == (uuid.UUID{}) {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+	ruleID, ok := pathUUID(w, r, 3, "rule")
+	if !ok {
 		return
 	}
-
-	// Verify rule ownership
-	var rule model.AlertRule
-	if err := h.db.Where("id = ? AND user_id = ?", ruleID, userID).First(&rule).Error; err != nil {
-		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert rule not found")
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// Delete related alerts
-	h.db.Where("rule_id = ?", ruleID).Delete(&model.Alert{})
-
-	// Delete rule
-	if err := h.db.Delete(&rule).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete alert rule")
+	if err := h.rules.Delete(r.Context(), ruleID, userID); err != nil {
+		respondWithAlertRuleError(w, err, "Failed to delete alert rule")
 		return
 	}
 
@@ -316,6 +164,16 @@ func (h *AlertHandler) DeleteAlertRule(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// respondWithAlertRuleError sends the status of an alert rule service error
+func respondWithAlertRuleError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrAlertRuleNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert rule not found")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
+
 // ListAlerts handles alert list requests
 func (h *AlertHandler) ListAlerts(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
@@ -358,7 +216,7 @@ func (h *AlertHandler) ListAlerts(w http.ResponseWriter, r *http.Request) {
 	// Get alerts with pagination
 	var alerts []model.Alert
 	offset := (page - 1) * pageSize
-	if err := query.Order("started_at DESC").Limit(pageSize).Offset(offset).Find(&alerts).Error; err != nil {
+	if err := query.Preload("Tickets").Order("started_at DESC").Limit(pageSize).Offset(offset).Find(&alerts).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve alerts")
 		return
 	}
@@ -0,0 +1,77 @@
+// Package handler provides the inbound email webhook replies to alert emails arrive at
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// maxInboundEmailBytes bounds inbound emails, attachments included
+const maxInboundEmailBytes = 10 << 20
+
+// AlertEmailHandler receives the replies to alert emails from the mail
+// provider's inbound webhook
+type AlertEmailHandler struct {
+	emails *service.AlertEmailService
+}
+
+// NewAlertEmailHandler creates a new alert email handler
+func NewAlertEmailHandler(emails *service.AlertEmailService) *AlertEmailHandler {
+	return &AlertEmailHandler{emails: emails}
+}
+
+// Inbound acts on a reply to an alert email (POST /api/v1/email/inbound). It is
+// public; the webhook authenticates with the inbound token as a bearer token or
+// basic auth password. It takes JSON, or the form fields Mailgun and SendGrid
+// post.
+func (h *AlertEmailHandler) Inbound(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if _, password, ok := r.BasicAuth(); ok {
+		token = password
+	}
+	if !h.emails.Authorize(token) {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Email replies are disabled or the token is invalid")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxInboundEmailBytes)
+	var email model.InboundEmail
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&email); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+			return
+		}
+	} else {
+		if err := r.ParseMultipartForm(maxInboundEmailBytes); err != nil && err != http.ErrNotMultipart {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+			return
+		}
+		email = model.InboundEmail{
+			From:    r.FormValue("from"),
+			To:      firstFormValue(r, "to", "recipient"),
+			Subject: r.FormValue("subject"),
+			Text:    firstFormValue(r, "stripped-text", "body-plain", "text"),
+		}
+	}
+
+	result, err := h.emails.HandleReply(&email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to process email reply")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// firstFormValue returns the first of the form fields that is set
+func firstFormValue(r *http.Request, keys ...string) string {
+	for _, key := range keys {
+		if value := r.FormValue(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
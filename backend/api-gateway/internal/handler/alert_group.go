@@ -0,0 +1,102 @@
+// Package handler provides HTTP handlers for alert group analysis
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// alertAnalysisTimeout bounds gathering evidence and asking the LLM for one analysis
+const alertAnalysisTimeout = 90 * time.Second
+
+// AlertGroupHandler handles root-cause analysis of alert groups
+type AlertGroupHandler struct {
+	db     *gorm.DB
+	groups *service.AlertGroupService
+}
+
+// NewAlertGroupHandler creates a new alert group handler
+func NewAlertGroupHandler(db *gorm.DB, groups *service.AlertGroupService) *AlertGroupHandler {
+	return &AlertGroupHandler{db: db, groups: groups}
+}
+
+// GetAnalysis returns the stored root-cause analysis of an alert group
+func (h *AlertGroupHandler) GetAnalysis(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	groupID, ok := alertGroupID(w, r)
+	if !ok {
+		return
+	}
+
+	analysis, err := h.groups.GetAnalysis(groupID, userID)
+	if err != nil {
+		respondWithAlertGroupError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, analysis)
+}
+
+// RegenerateAnalysis gathers fresh evidence and analyzes an alert group again
+func (h *AlertGroupHandler) RegenerateAnalysis(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	groupID, ok := alertGroupID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.RegenerateAlertGroupAnalysisRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), alertAnalysisTimeout)
+	defer cancel()
+
+	analysis, err := h.groups.Analyze(ctx, groupID, userID, !req.DisableLLM)
+	if err != nil {
+		respondWithAlertGroupError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, analysis)
+}
+
+// alertGroupID parses the group ID from /api/v1/alert-groups/{id}/analysis[/regenerate]
+func alertGroupID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	parts := splitPath(r.URL.Path)
+	if len(parts) < 5 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(parts[3])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid alert group ID format")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func respondWithAlertGroupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrAlertGroupNotFound) {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert group not found")
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to analyze alert group")
+}
@@ -0,0 +1,275 @@
+// Package handler provides HTTP handlers for dashboard annotations
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// maxAnnotationWebhookBytes caps the body of an inbound annotation
+const maxAnnotationWebhookBytes = 64 << 10
+
+// AnnotationHandler handles annotations and the webhooks that record them
+type AnnotationHandler struct {
+	db          *gorm.DB
+	annotations *service.AnnotationService
+}
+
+// NewAnnotationHandler creates a new annotation handler
+func NewAnnotationHandler(db *gorm.DB, annotations *service.AnnotationService) *AnnotationHandler {
+	return &AnnotationHandler{db: db, annotations: annotations}
+}
+
+// CreateAnnotation records an annotation (POST /api/v1/annotations)
+func (h *AnnotationHandler) CreateAnnotation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateAnnotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	username, _ := r.Context().Value("username").(string)
+	annotation, err := h.annotations.Create(userID, username, &req)
+	if err != nil {
+		respondWithAnnotationError(w, err, "Failed to create annotation")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, annotation)
+}
+
+// ListAnnotations lists annotations, newest first, with page/pageSize and the
+// optional from, to, kind, tag (repeatable), dashboardId and clusterId filters
+func (h *AnnotationHandler) ListAnnotations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	filter := model.AnnotationFilter{
+		Kind:        model.AnnotationKind(params.Get("kind")),
+		Tags:        params["tag"],
+		DashboardID: queryUUID(r, "dashboardId"),
+		ClusterID:   queryUUID(r, "clusterId"),
+	}
+	if from, err := parseQueryTime(params.Get("from")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid from time")
+		return
+	} else if !from.IsZero() {
+		filter.From = &from
+	}
+	if to, err := parseQueryTime(params.Get("to")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid to time")
+		return
+	} else if !to.IsZero() {
+		filter.To = &to
+	}
+
+	page, pageSize := pageParams(r)
+	annotations, total, err := h.annotations.List(userID, filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch annotations")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":     annotations,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// GetAnnotation gets an annotation (GET /api/v1/annotations/{id})
+func (h *AnnotationHandler) GetAnnotation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "annotation")
+	if !ok {
+		return
+	}
+
+	annotation, err := h.annotations.Get(userID, id)
+	if err != nil {
+		respondWithAnnotationError(w, err, "Failed to fetch annotation")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, annotation)
+}
+
+// UpdateAnnotation updates an annotation (PUT /api/v1/annotations/{id})
+func (h *AnnotationHandler) UpdateAnnotation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "annotation")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateAnnotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	annotation, err := h.annotations.Update(userID, id, &req)
+	if err != nil {
+		respondWithAnnotationError(w, err, "Failed to update annotation")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, annotation)
+}
+
+// DeleteAnnotation deletes an annotation (DELETE /api/v1/annotations/{id})
+func (h *AnnotationHandler) DeleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "annotation")
+	if !ok {
+		return
+	}
+
+	if err := h.annotations.Delete(userID, id); err != nil {
+		respondWithAnnotationError(w, err, "Failed to delete annotation")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Annotation deleted successfully",
+	})
+}
+
+// ============== Annotation webhooks ==============
+
+// CreateWebhook creates an annotation webhook and returns its token, which is
+// shown only once (POST /api/v1/annotations/webhooks)
+func (h *AnnotationHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateAnnotationWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	webhook, err := h.annotations.CreateWebhook(userID, &req)
+	if err != nil {
+		respondWithAnnotationError(w, err, "Failed to create annotation webhook")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, webhook)
+}
+
+// ListWebhooks lists the annotation webhooks (GET /api/v1/annotations/webhooks)
+func (h *AnnotationHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	webhooks, err := h.annotations.ListWebhooks(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch annotation webhooks")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, webhooks)
+}
+
+// RotateWebhookToken replaces the token of an annotation webhook and returns
+// the new one (POST /api/v1/annotations/webhooks/{id}/token)
+func (h *AnnotationHandler) RotateWebhookToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "annotation webhook")
+	if !ok {
+		return
+	}
+
+	webhook, err := h.annotations.RotateWebhookToken(userID, id)
+	if err != nil {
+		respondWithAnnotationError(w, err, "Failed to rotate annotation webhook token")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, webhook)
+}
+
+// DeleteWebhook deletes an annotation webhook (DELETE /api/v1/annotations/webhooks/{id})
+func (h *AnnotationHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "annotation webhook")
+	if !ok {
+		return
+	}
+
+	if err := h.annotations.DeleteWebhook(userID, id); err != nil {
+		respondWithAnnotationError(w, err, "Failed to delete annotation webhook")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Annotation webhook deleted successfully",
+	})
+}
+
+// Inbound records an annotation posted to a webhook, e.g. by a deploy pipeline
+// (POST /api/v1/annotations/inbound/{id}). It is public; the caller presents the
+// webhook's token as a bearer token, never in the query, which is logged.
+func (h *AnnotationHandler) Inbound(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(w, r, 4, "annotation webhook")
+	if !ok {
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	var req model.InboundAnnotationRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxAnnotationWebhookBytes)).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	annotation, err := h.annotations.HandleInbound(id, token, &req)
+	if err != nil {
+		respondWithAnnotationError(w, err, "Failed to record annotation")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, annotation)
+}
+
+// respondWithAnnotationError maps annotation service errors to responses
+func respondWithAnnotationError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidAnnotation):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrAnnotationNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Annotation not found")
+	case errors.Is(err, service.ErrAnnotationWebhookNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Annotation webhook not found")
+	case errors.Is(err, service.ErrAnnotationUnauthorized):
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid annotation webhook token")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
@@ -0,0 +1,202 @@
+// Package handler provides the batch endpoint running many GET requests in one
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxBatchItems limits the requests of one batch
+	maxBatchItems = 20
+	// batchConcurrency is how many requests of a batch run at once
+	batchConcurrency = 6
+	// maxBatchItemResponse limits the body of each response in a batch
+	maxBatchItemResponse = 4 << 20
+)
+
+// batchDeniedSuffixes are the GET routes that upgrade to websockets or download
+// files, whose responses cannot be batched
+var batchDeniedSuffixes = []string{"/ws", "/export", "/download"}
+
+// APIBatchHandler runs batches of GET requests, so pages can load everything
+// they show in one round trip
+type APIBatchHandler struct {
+	logger *zap.Logger
+}
+
+// NewAPIBatchHandler creates a new batch handler
+func NewAPIBatchHandler(logger *zap.Logger) *APIBatchHandler {
+	return &APIBatchHandler{logger: logger}
+}
+
+// Batch runs the GET requests of a model.APIBatchRequest concurrently through the
+// API router, as the calling user, and answers with the status and body of each.
+// Every request is authorized as if the user had sent it alone.
+func (h *APIBatchHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	var req model.APIBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if len(req.Requests) == 0 {
+		respondWithError(w, http.StatusBadRequest, "MISSING_FIELDS", "requests is required")
+		return
+	}
+	if len(req.Requests) > maxBatchItems {
+		respondWithError(w, http.StatusBadRequest, "TOO_MANY_REQUESTS",
+			fmt.Sprintf("A batch holds at most %d requests", maxBatchItems))
+		return
+	}
+
+	seen := make(map[string]bool, len(req.Requests))
+	for i := range req.Requests {
+		item := &req.Requests[i]
+		if item.ID == "" {
+			item.ID = strconv.Itoa(i)
+		}
+		if seen[item.ID] {
+			respondWithError(w, http.StatusBadRequest, "DUPLICATE_ID", fmt.Sprintf("Request ID %q is used twice", item.ID))
+			return
+		}
+		seen[item.ID] = true
+	}
+
+	results := make([]model.APIBatchResult, len(req.Requests))
+	slots := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for i, item := range req.Requests {
+		wg.Add(1)
+		go func(i int, item model.APIBatchItem) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i] = h.run(r, item)
+		}(i, item)
+	}
+	wg.Wait()
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"responses": results,
+	})
+}
+
+// run runs one request of a batch sent with r
+func (h *APIBatchHandler) run(r *http.Request, item model.APIBatchItem) (result model.APIBatchResult) {
+	result.ID = item.ID
+	refuse := func(status int, code, message string) model.APIBatchResult {
+		result.Status = status
+		result.Error = &model.APIBatchError{Code: code, Message: message}
+		return result
+	}
+
+	if item.Method != "" && !strings.EqualFold(item.Method, http.MethodGet) {
+		return refuse(http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only GET requests can be batched")
+	}
+	target, err := batchTarget(item.Path)
+	if err != nil {
+		return refuse(http.StatusBadRequest, "INVALID_PATH", err.Error())
+	}
+
+	sub, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		return refuse(http.StatusBadRequest, "INVALID_PATH", err.Error())
+	}
+	sub.Header = r.Header.Clone()
+	sub.Header.Del("Content-Type")
+	sub.Header.Del("Content-Length")
+	sub.RemoteAddr = r.RemoteAddr
+	sub.Host = r.Host
+
+	// A handler panicking must not take the whole batch, or the gateway, down
+	defer func() {
+		if p := recover(); p != nil {
+			h.logger.Error("batch request panicked", zap.String("path", target.Path), zap.Any("error", p),
+				zap.String("stack", string(debug.Stack())))
+			result = refuse(http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
+		}
+	}()
+
+	rec := newBatchRecorder()
+	API(rec, sub)
+
+	if rec.overflow {
+		return refuse(http.StatusBadGateway, "RESPONSE_TOO_LARGE",
+			fmt.Sprintf("Response exceeds %d bytes; request it on its own", maxBatchItemResponse))
+	}
+	result.Status = rec.status
+	if result.Status == 0 {
+		result.Status = http.StatusOK
+	}
+	if body := bytes.TrimSpace(rec.body.Bytes()); len(body) > 0 {
+		if !json.Valid(body) {
+			return refuse(http.StatusBadGateway, "INVALID_RESPONSE", "Response is not JSON")
+		}
+		result.Body = body
+	}
+	return result
+}
+
+// batchTarget parses the path of a batch item, which must be a GET API route
+// that answers with JSON
+func batchTarget(raw string) (*url.URL, error) {
+	target, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path: %v", err)
+	}
+	if target.Scheme != "" || target.Host != "" || target.Path != path.Clean(target.Path) ||
+		!strings.HasPrefix(target.Path, "/api/v1/") {
+		return nil, fmt.Errorf("path must be an /api/v1 path")
+	}
+	if target.Path == "/api/v1/batch" || strings.HasPrefix(target.Path, "/api/v1/agent/") {
+		return nil, fmt.Errorf("%s cannot be batched", target.Path)
+	}
+	for _, suffix := range batchDeniedSuffixes {
+		if strings.HasSuffix(target.Path, suffix) {
+			return nil, fmt.Errorf("%s cannot be batched", target.Path)
+		}
+	}
+	return target, nil
+}
+
+// batchRecorder captures the response of a batch item, up to maxBatchItemResponse
+type batchRecorder struct {
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func newBatchRecorder() *batchRecorder {
+	return &batchRecorder{header: make(http.Header)}
+}
+
+func (rec *batchRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *batchRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *batchRecorder) Write(p []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	if rec.body.Len()+len(p) > maxBatchItemResponse {
+		rec.overflow = true
+		return 0, fmt.Errorf("response exceeds %d bytes", maxBatchItemResponse)
+	}
+	return rec.body.Write(p)
+}
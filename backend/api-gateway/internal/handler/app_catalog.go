@@ -0,0 +1,216 @@
+// Package handler provides HTTP handlers for the app catalog
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// AppCatalogHandler lists the curated apps of the catalog, installs them in
+// clusters and manages the installed ones
+type AppCatalogHandler struct {
+	catalog *service.AppCatalogService
+}
+
+// NewAppCatalogHandler creates a new app catalog handler
+func NewAppCatalogHandler(catalog *service.AppCatalogService) *AppCatalogHandler {
+	return &AppCatalogHandler{catalog: catalog}
+}
+
+// ListApps lists the apps of the catalog, those of ?category= when it is set
+func (h *AppCatalogHandler) ListApps(w http.ResponseWriter, r *http.Request) {
+	apps := h.catalog.Apps(r.URL.Query().Get("category"))
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  apps,
+		"total": len(apps),
+	})
+}
+
+// GetApp gets an app of the catalog with its install form
+func (h *AppCatalogHandler) GetApp(w http.ResponseWriter, r *http.Request) {
+	app, err := h.catalog.App(appCatalogPathID(r))
+	if err != nil {
+		respondWithAppCatalogError(w, err, "Failed to fetch app")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": app,
+	})
+}
+
+// InstallApp installs an app of the catalog in a cluster
+func (h *AppCatalogHandler) InstallApp(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.InstallAppRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if req.ClusterID == uuid.Nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "clusterId is required")
+		return
+	}
+
+	username, _ := r.Context().Value("username").(string)
+	installation, err := h.catalog.Install(r.Context(), userID, username, appCatalogPathID(r), &req)
+	if err != nil {
+		respondWithAppCatalogError(w, err, "Failed to install app")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": installation,
+	})
+}
+
+// ListInstallations lists the user's installed apps, of ?clusterId= and in
+// ?status= when they are set
+func (h *AppCatalogHandler) ListInstallations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var clusterID *uuid.UUID
+	if value := r.URL.Query().Get("clusterId"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid cluster ID")
+			return
+		}
+		clusterID = &id
+	}
+
+	installations, err := h.catalog.Installations(userID, clusterID, model.AppInstallationStatus(r.URL.Query().Get("status")))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list installed apps")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  installations,
+		"total": len(installations),
+	})
+}
+
+// GetInstallation gets an installed app with its latest health checks
+func (h *AppCatalogHandler) GetInstallation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "installation")
+	if !ok {
+		return
+	}
+
+	installation, err := h.catalog.Installation(userID, id)
+	if err != nil {
+		respondWithAppCatalogError(w, err, "Failed to fetch installed app")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": installation,
+	})
+}
+
+// UpgradeInstallation changes the inputs or chart version of an installed app
+func (h *AppCatalogHandler) UpgradeInstallation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "installation")
+	if !ok {
+		return
+	}
+
+	var req model.UpgradeAppRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	username, _ := r.Context().Value("username").(string)
+	installation, err := h.catalog.Upgrade(r.Context(), userID, username, id, &req)
+	if err != nil {
+		respondWithAppCatalogError(w, err, "Failed to upgrade app")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": installation,
+	})
+}
+
+// CheckInstallation runs the health checks of an installed app now
+func (h *AppCatalogHandler) CheckInstallation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "installation")
+	if !ok {
+		return
+	}
+
+	installation, err := h.catalog.Check(r.Context(), userID, id)
+	if err != nil {
+		respondWithAppCatalogError(w, err, "Failed to check app health")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": installation,
+	})
+}
+
+// UninstallInstallation uninstalls an installed app
+func (h *AppCatalogHandler) UninstallInstallation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "installation")
+	if !ok {
+		return
+	}
+
+	installation, err := h.catalog.Uninstall(userID, id)
+	if err != nil {
+		respondWithAppCatalogError(w, err, "Failed to uninstall app")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": installation,
+	})
+}
+
+// appCatalogPathID returns the app ID of /api/v1/app-catalog/apps/{id}
+func appCatalogPathID(r *http.Request) string {
+	if parts := splitPath(r.URL.Path); len(parts) > 4 {
+		return parts[4]
+	}
+	return ""
+}
+
+// respondWithAppCatalogError sends the status of an app catalog error
+func respondWithAppCatalogError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrAppNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "App not found")
+	case errors.Is(err, service.ErrAppInstallationNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Installed app not found")
+	case errors.Is(err, service.ErrAppInstalled):
+		respondWithError(w, http.StatusConflict, "ALREADY_INSTALLED", err.Error())
+	case errors.Is(err, service.ErrInvalidAppInstall):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	default:
+		respondWithHelmReleaseError(w, err, fallback)
+	}
+}
@@ -7,13 +7,15 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
 	"github.com/wangjialin/myops/pkg/model"
 	"gorm.io/gorm"
 )
 
 // AuditHandler handles audit log operations
 type AuditHandler struct {
-	db *gorm.DB
+	db    *gorm.DB
+	chain *service.AuditChainService
 }
 
 // NewAuditHandler creates a new audit handler
@@ -21,6 +23,11 @@ func NewAuditHandler(db *gorm.DB) *AuditHandler {
 	return &AuditHandler{db: db}
 }
 
+// SetAuditChainService enables verifying the audit log chain and listing its checkpoints
+func (h *AuditHandler) SetAuditChainService(chain *service.AuditChainService) {
+	h.chain = chain
+}
+
 // ListAuditLogs handles audit log list requests
 func (h *AuditHandler) ListAuditLogs(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (admin only)
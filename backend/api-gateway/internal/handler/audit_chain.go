@@ -0,0 +1,74 @@
+// Package handler provides HTTP handlers for verifying the audit log chain
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+)
+
+// VerifyAuditChain verifies the audit log chain, between the from and to
+// sequences when given (GET /api/v1/audit-logs/verify)
+func (h *AuditHandler) VerifyAuditChain(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "audit", "view", nil, "") {
+		return
+	}
+
+	var from, to int64
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, err = strconv.ParseInt(value, 10, 64); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "from must be a sequence number")
+			return
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, err = strconv.ParseInt(value, 10, 64); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "to must be a sequence number")
+			return
+		}
+	}
+
+	result, err := h.chain.Verify(from, to)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAuditChainRange) {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "from and to must be positive and in order")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to verify audit log chain")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// ListAuditCheckpoints lists the checkpoints of the audit log chain, newest first
+// (GET /api/v1/audit-logs/checkpoints)
+func (h *AuditHandler) ListAuditCheckpoints(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "audit", "view", nil, "") {
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+	checkpoints, total, err := h.chain.ListCheckpoints(limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch audit checkpoints")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  checkpoints,
+		"total": total,
+	})
+}
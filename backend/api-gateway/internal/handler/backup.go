@@ -0,0 +1,363 @@
+// Package handler provides HTTP handlers for platform backups and their targets
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// BackupHandler handles backups of the platform database and configuration
+type BackupHandler struct {
+	db      *gorm.DB
+	backups *service.BackupService
+}
+
+// NewBackupHandler creates a new backup handler
+func NewBackupHandler(db *gorm.DB, backups *service.BackupService) *BackupHandler {
+	return &BackupHandler{db: db, backups: backups}
+}
+
+// GetStatus reports, per target, the last successful and failed backups and
+// whether backups are overdue
+func (h *BackupHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "backups", "view", nil, "") {
+		return
+	}
+
+	overview, err := h.backups.Overview()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch backup status")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": overview,
+	})
+}
+
+// ListTargets lists the backup targets
+func (h *BackupHandler) ListTargets(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "backups", "view", nil, "") {
+		return
+	}
+
+	targets, err := h.backups.ListTargets()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch backup targets")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  targets,
+		"total": len(targets),
+	})
+}
+
+// CreateTarget adds a backup target
+func (h *BackupHandler) CreateTarget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "backups", "manage", nil, "") {
+		return
+	}
+
+	var req model.CreateBackupTargetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	target, err := h.backups.CreateTarget(userID, &req)
+	if err != nil {
+		respondWithBackupError(w, err, "Failed to create backup target")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, target)
+}
+
+// GetTarget gets a backup target
+func (h *BackupHandler) GetTarget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "backups", "view", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "backup target")
+	if !ok {
+		return
+	}
+
+	target, err := h.backups.GetTarget(id)
+	if err != nil {
+		respondWithBackupError(w, err, "Failed to fetch backup target")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, target)
+}
+
+// UpdateTarget changes a backup target
+func (h *BackupHandler) UpdateTarget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "backups", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "backup target")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateBackupTargetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	target, err := h.backups.UpdateTarget(id, &req)
+	if err != nil {
+		respondWithBackupError(w, err, "Failed to update backup target")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, target)
+}
+
+// DeleteTarget removes a backup target. Its archives are left in storage.
+func (h *BackupHandler) DeleteTarget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "backups", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "backup target")
+	if !ok {
+		return
+	}
+
+	if err := h.backups.DeleteTarget(id); err != nil {
+		respondWithBackupError(w, err, "Failed to delete backup target")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Backup target deleted successfully",
+	})
+}
+
+// TestTarget checks a backup target can be written to and read from
+func (h *BackupHandler) TestTarget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "backups", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "backup target")
+	if !ok {
+		return
+	}
+
+	if err := h.backups.TestTarget(r.Context(), id); err != nil {
+		if errors.Is(err, service.ErrBackupTargetNotFound) {
+			respondWithBackupError(w, err, "")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// ListBackups lists backups, most recent first, with optional targetId and status
+// filters and page/pageSize
+func (h *BackupHandler) ListBackups(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "backups", "view", nil, "") {
+		return
+	}
+
+	params := r.URL.Query()
+	filter := model.BackupFilter{Status: model.BackupStatus(params.Get("status"))}
+	if v := params.Get("targetId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid targetId format")
+			return
+		}
+		filter.TargetID = &id
+	}
+
+	page := 1
+	pageSize := 50
+	if p, err := strconv.Atoi(params.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if ps, err := strconv.Atoi(params.Get("pageSize")); err == nil && ps > 0 && ps <= 500 {
+		pageSize = ps
+	}
+	filter.Limit = pageSize
+	filter.Offset = (page - 1) * pageSize
+
+	backups, total, err := h.backups.List(&filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch backups")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":       backups,
+		"total":      total,
+		"page":       page,
+		"pageSize":   pageSize,
+		"totalPages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// StartBackup starts a backup to the target in the body. It runs in the
+// background; the returned backup is polled for its status.
+func (h *BackupHandler) StartBackup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "backups", "manage", nil, "") {
+		return
+	}
+
+	var req struct {
+		TargetID uuid.UUID `json:"targetId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	backup, err := h.backups.Start(req.TargetID, &userID)
+	if err != nil {
+		respondWithBackupError(w, err, "Failed to start backup")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": backup,
+	})
+}
+
+// GetBackup gets a backup
+func (h *BackupHandler) GetBackup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "backups", "view", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "backup")
+	if !ok {
+		return
+	}
+
+	backup, err := h.backups.Get(id)
+	if err != nil {
+		respondWithBackupError(w, err, "Failed to fetch backup")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": backup,
+	})
+}
+
+// DownloadBackup streams a completed backup's archive
+func (h *BackupHandler) DownloadBackup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "backups", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "backup")
+	if !ok {
+		return
+	}
+
+	backup, archive, err := h.backups.Open(r.Context(), id)
+	if err != nil {
+		respondWithBackupError(w, err, "Failed to open backup")
+		return
+	}
+	defer archive.Close()
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Length", strconv.FormatInt(backup.Size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", backup.Key))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, archive)
+}
+
+// DeleteBackup removes a backup and its archive
+func (h *BackupHandler) DeleteBackup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "backups", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "backup")
+	if !ok {
+		return
+	}
+
+	if err := h.backups.Delete(r.Context(), id); err != nil {
+		respondWithBackupError(w, err, "Failed to delete backup")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Backup deleted successfully",
+	})
+}
+
+// respondWithBackupError maps backup service errors to responses
+func respondWithBackupError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidBackupTarget):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrBackupTargetNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Backup target not found")
+	case errors.Is(err, service.ErrBackupNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Backup not found")
+	case errors.Is(err, service.ErrBackupInProgress):
+		respondWithError(w, http.StatusConflict, "BACKUP_IN_PROGRESS", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
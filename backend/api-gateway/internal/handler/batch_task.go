@@ -4,12 +4,15 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/db"
 	"github.com/wangjialin/myops/pkg/model"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -20,6 +23,7 @@ type BatchTaskHandler struct {
 	db                *gorm.DB
 	logger            *zap.Logger
 	taskExecutor      *service.BatchTaskExecutor
+	operations        *service.OperationService
 }
 
 // NewBatchTaskHandler creates a new batch task handler
@@ -31,6 +35,16 @@ func NewBatchTaskHandler(db *gorm.DB, logger *zap.Logger) *BatchTaskHandler {
 	}
 }
 
+// SetEventBus sets the bus batch task events are published on
+func (h *BatchTaskHandler) SetEventBus(events *service.EventBus) {
+	h.taskExecutor.SetEventBus(events)
+}
+
+// SetOperations sets the service task executions run as operations of
+func (h *BatchTaskHandler) SetOperations(operations *service.OperationService) {
+	h.operations = operations
+}
+
 // CreateBatchTask handles batch task creation requests
 func (h *BatchTaskHandler) CreateBatchTask(w http.ResponseWriter, r *http.Request) {
 	var req model.CreateBatchTaskRequest
@@ -96,22 +110,23 @@ func (h *BatchTaskHandler) CreateBatchTask(w http.ResponseWriter, r *http.Reques
 		TotalHosts:  int32(len(req.HostIDs)),
 	}
 
-	if err := h.db.Create(task).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create task")
-		return
-	}
-
-	// Create task host records
-	taskHosts := make([]model.BatchTaskHost, len(req.HostIDs))
-	for i, hostID := range req.HostIDs {
-		taskHosts[i] = model.BatchTaskHost{
-			BatchTaskID: task.ID,
-			HostID:      hostID,
-			Status:      model.BatchTaskStatusPending,
+	// Create the task with its host records
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(task).Error; err != nil {
+			return err
 		}
-	}
-	if err := h.db.Create(&taskHosts).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create task hosts")
+		taskHosts := make([]model.BatchTaskHost, len(req.HostIDs))
+		for i, hostID := range req.HostIDs {
+			taskHosts[i] = model.BatchTaskHost{
+				BatchTaskID: task.ID,
+				HostID:      hostID,
+				Status:      model.BatchTaskStatusPending,
+			}
+		}
+		return tx.Create(&taskHosts).Error
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create task")
 		return
 	}
 
@@ -163,21 +178,31 @@ func (h *BatchTaskHandler) ExecuteBatchTask(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
-	// Execute task asynchronously
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 24*time.Hour)
-		defer cancel()
+	// Execute task as an operation, polled until it is done
+	operation, err := h.operations.Start(userID, service.OperationSpec{
+		Type:         model.OperationBatchTaskExecute,
+		ResourceType: "batch_task",
+		ResourceID:   &task.ID,
+		Message:      fmt.Sprintf("Running %s on %d hosts", task.Name, len(hostIDs)),
+		Cancellable:  true,
+		Timeout:      24 * time.Hour,
+	}, func(ctx context.Context) (interface{}, error) {
 		if err := h.taskExecutor.ExecuteTask(ctx, task.ID, hostIDs); err != nil {
 			h.logger.Error("task execution failed",
 				zap.String("taskId", task.ID.String()),
 				zap.Error(err))
+			return nil, err
 		}
-	}()
-
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"message": "Task execution started",
-		"taskId":  task.ID,
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return h.taskExecutor.GetTaskProgress(task.ID)
 	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to start task execution")
+		return
+	}
+	respondAccepted(w, operation)
 }
 
 // GetBatchTask handles batch task retrieval requests
@@ -322,6 +347,8 @@ func (h *BatchTaskHandler) CancelBatchTask(w http.ResponseWriter, r *http.Reques
 		respondWithError(w, http.StatusInternalServerError, "CANCEL_FAILED", err.Error())
 		return
 	}
+	// Stop the hosts still running, when the task runs as an operation
+	h.operations.CancelResource(userID, task.ID)
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Task cancelled successfully",
@@ -369,17 +396,19 @@ func (h *BatchTaskHandler) DeleteBatchTask(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Delete task hosts
-	if err := h.db.Where("batch_task_id = ?", taskID).Delete(&model.BatchTaskHost{}).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete task hosts")
-		return
-	}
+	var distribution model.FileDistribution
+	staged := h.db.Where("batch_task_id = ?", taskID).First(&distribution).Error == nil
 
-	// Delete task
-	if err := h.db.Delete(&task).Error; err != nil {
+	// Delete the task with its host records and file distribution
+	err = db.DeleteWithChildren(h.db, &task, "batch_task_id", taskID, &model.FileDistribution{}, &model.BatchTaskHost{})
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete task")
 		return
 	}
+	// The staged file is only removed once nothing refers to it
+	if staged {
+		os.Remove(distribution.StagedPath)
+	}
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Task deleted successfully",
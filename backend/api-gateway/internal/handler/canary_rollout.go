@@ -0,0 +1,194 @@
+// Package handler provides HTTP handlers for canary and blue/green rollouts
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// CanaryRolloutHandler starts canary and blue/green rollouts of deployments
+// and promotes or aborts them
+type CanaryRolloutHandler struct {
+	canaries *service.CanaryRolloutService
+}
+
+// NewCanaryRolloutHandler creates a new canary rollout handler
+func NewCanaryRolloutHandler(canaries *service.CanaryRolloutService) *CanaryRolloutHandler {
+	return &CanaryRolloutHandler{canaries: canaries}
+}
+
+// ListRollouts lists the rollouts the user may view, those of ?clusterId=
+// when it is set and only the active ones with ?active=true
+func (h *CanaryRolloutHandler) ListRollouts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var clusterID *uuid.UUID
+	if value := r.URL.Query().Get("clusterId"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid cluster ID")
+			return
+		}
+		clusterID = &id
+	}
+
+	rollouts, err := h.canaries.Rollouts(userID, clusterID, r.URL.Query().Get("active") == "true")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list canary rollouts")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  rollouts,
+		"total": len(rollouts),
+	})
+}
+
+// CreateRollout starts a rollout
+func (h *CanaryRolloutHandler) CreateRollout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateCanaryRolloutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if req.ClusterID == uuid.Nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "clusterId is required")
+		return
+	}
+
+	username, _ := r.Context().Value("username").(string)
+	rollout, err := h.canaries.Create(r.Context(), userID, username, &req)
+	if err != nil {
+		respondWithCanaryError(w, err, "Failed to start canary rollout")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"data": rollout,
+	})
+}
+
+// GetRollout gets a rollout with its analyses
+func (h *CanaryRolloutHandler) GetRollout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "rollout")
+	if !ok {
+		return
+	}
+
+	rollout, err := h.canaries.Rollout(userID, id)
+	if err != nil {
+		respondWithCanaryError(w, err, "Failed to fetch canary rollout")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": rollout,
+	})
+}
+
+// PromoteRollout moves a rollout on to its next step, or with {"full": true}
+// promotes it at once
+func (h *CanaryRolloutHandler) PromoteRollout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "rollout")
+	if !ok {
+		return
+	}
+
+	var req model.CanaryActionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+			return
+		}
+	}
+
+	username, _ := r.Context().Value("username").(string)
+	rollout, err := h.canaries.Promote(userID, username, id, req.Full)
+	if err != nil {
+		respondWithCanaryError(w, err, "Failed to promote canary rollout")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": rollout,
+	})
+}
+
+// AbortRollout rolls a rollout back
+func (h *CanaryRolloutHandler) AbortRollout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "rollout")
+	if !ok {
+		return
+	}
+
+	username, _ := r.Context().Value("username").(string)
+	rollout, err := h.canaries.Abort(userID, username, id)
+	if err != nil {
+		respondWithCanaryError(w, err, "Failed to abort canary rollout")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": rollout,
+	})
+}
+
+// DeleteRollout removes a finished rollout
+func (h *CanaryRolloutHandler) DeleteRollout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "rollout")
+	if !ok {
+		return
+	}
+
+	if err := h.canaries.Delete(userID, id); err != nil {
+		respondWithCanaryError(w, err, "Failed to delete canary rollout")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Canary rollout deleted",
+	})
+}
+
+// respondWithCanaryError maps canary rollout service errors to responses
+func respondWithCanaryError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrCanaryRolloutNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Canary rollout not found")
+	case errors.Is(err, service.ErrClusterNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	case errors.Is(err, service.ErrInvalidCanaryRollout):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrCanaryRolloutForbidden):
+		respondWithError(w, http.StatusForbidden, "PERMISSION_DENIED", err.Error())
+	case errors.Is(err, service.ErrCanaryRolloutInProgress):
+		respondWithError(w, http.StatusConflict, "ROLLOUT_IN_PROGRESS", err.Error())
+	case errors.Is(err, service.ErrCanaryRolloutFinished):
+		respondWithError(w, http.StatusConflict, "ROLLOUT_FINISHED", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
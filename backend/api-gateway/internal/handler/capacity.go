@@ -0,0 +1,84 @@
+// Package handler provides HTTP handlers for cluster capacity analysis
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// defaultCapacityWindow is the metrics history analyzed when no duration is given
+const defaultCapacityWindow = 7 * 24 * time.Hour
+
+// GetClusterCapacity handles capacity and rightsizing analysis requests.
+// With format=text the recommendations are returned as plain text for the AI assistant.
+func (h *ClusterMetricsHandler) GetClusterCapacity(w http.ResponseWriter, r *http.Request) {
+	// Get cluster ID from URL path
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) < 5 || pathParts[4] != "capacity" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+
+	clusterID, err := uuid.Parse(pathParts[3])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_CLUSTER_ID", "Invalid cluster ID")
+		return
+	}
+
+	// Get user ID from context
+	var userID uuid.UUID
+	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
+		if uid, ok := userIDVal.(string); ok {
+			userID, _ = uuid.Parse(uid)
+		}
+	}
+
+	if userID == (uuid.UUID{}) {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return
+	}
+
+	// Verify cluster ownership
+	var cluster model.K8sCluster
+	if err := h.db.Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+		return
+	}
+
+	// Parse query parameters
+	window := defaultCapacityWindow
+	if durationStr := r.URL.Query().Get("duration"); durationStr != "" {
+		window, err = time.ParseDuration(durationStr)
+		if err != nil || window <= 0 {
+			respondWithError(w, http.StatusBadRequest, "INVALID_DURATION", "Invalid duration format")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	report, err := h.capacity.Analyze(ctx, &cluster, window)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ANALYSIS_ERROR", "Failed to analyze cluster capacity")
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"context": service.CapacityContext(report),
+			},
+		})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": report,
+	})
+}
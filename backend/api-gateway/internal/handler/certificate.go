@@ -0,0 +1,191 @@
+// Package handler provides HTTP handlers for certificate expiry monitoring
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// CertificateHandler handles the user's certificate inventory
+type CertificateHandler struct {
+	certificates *service.CertificateService
+}
+
+// NewCertificateHandler creates a new certificate handler
+func NewCertificateHandler(certificates *service.CertificateService) *CertificateHandler {
+	return &CertificateHandler{certificates: certificates}
+}
+
+// ListCertificates lists the user's certificates, those expiring first first,
+// optionally by source, status, cluster and a search term, with counts by
+// status (GET /api/v1/certificates)
+func (h *CertificateHandler) ListCertificates(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	page, pageSize := pageParams(r)
+	filter := &model.CertificateFilter{
+		UserID:    userID,
+		Source:    model.CertificateSource(query.Get("source")),
+		Status:    model.CertificateStatus(query.Get("status")),
+		ClusterID: queryUUID(r, "clusterId"),
+		Search:    query.Get("search"),
+		Page:      page,
+		PageSize:  pageSize,
+	}
+
+	certificates, total, summary, err := h.certificates.List(filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch certificates")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":     certificates,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+		"summary":  summary,
+	})
+}
+
+// CreateCertificate starts monitoring the certificate of a TLS endpoint and
+// returns it as first checked (POST /api/v1/certificates)
+func (h *CertificateHandler) CreateCertificate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateCertificateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	certificate, err := h.certificates.Create(r.Context(), userID, &req)
+	if err != nil {
+		respondWithCertificateError(w, err, "Failed to add certificate")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, certificate)
+}
+
+// ScanCertificates checks the user's endpoints and discovers the certificates
+// of the user's clusters now (POST /api/v1/certificates/scan)
+func (h *CertificateHandler) ScanCertificates(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.certificates.Scan(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to scan certificates")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Certificates scanned successfully",
+	})
+}
+
+// GetCertificate gets a certificate (GET /api/v1/certificates/{id})
+func (h *CertificateHandler) GetCertificate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "certificate")
+	if !ok {
+		return
+	}
+
+	certificate, err := h.certificates.Get(userID, id)
+	if err != nil {
+		respondWithCertificateError(w, err, "Failed to fetch certificate")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, certificate)
+}
+
+// UpdateCertificate changes a certificate's name, endpoint, thresholds or
+// whether it is monitored (PUT /api/v1/certificates/{id})
+func (h *CertificateHandler) UpdateCertificate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "certificate")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateCertificateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	certificate, err := h.certificates.Update(r.Context(), userID, id, &req)
+	if err != nil {
+		respondWithCertificateError(w, err, "Failed to update certificate")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, certificate)
+}
+
+// DeleteCertificate stops monitoring an endpoint certificate (DELETE /api/v1/certificates/{id})
+func (h *CertificateHandler) DeleteCertificate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "certificate")
+	if !ok {
+		return
+	}
+
+	if err := h.certificates.Delete(userID, id); err != nil {
+		respondWithCertificateError(w, err, "Failed to delete certificate")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Certificate deleted successfully",
+	})
+}
+
+// CheckCertificate checks a certificate now (POST /api/v1/certificates/{id}/check)
+func (h *CertificateHandler) CheckCertificate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "certificate")
+	if !ok {
+		return
+	}
+
+	certificate, err := h.certificates.Check(r.Context(), userID, id)
+	if err != nil {
+		respondWithCertificateError(w, err, "Failed to check certificate")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, certificate)
+}
+
+// respondWithCertificateError maps certificate service errors to responses
+func respondWithCertificateError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidCertificate):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrCertificateNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Certificate not found")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
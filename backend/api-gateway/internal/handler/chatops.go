@@ -0,0 +1,263 @@
+// Package handler provides HTTP handlers for ChatOps integrations
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// maxChatRequestBytes bounds the body of inbound chat commands
+const maxChatRequestBytes = 1 << 20
+
+// ChatOpsHandler handles ChatOps integrations, the links of chat accounts to
+// users and the commands chat systems send
+type ChatOpsHandler struct {
+	chatops *service.ChatOpsService
+}
+
+// NewChatOpsHandler creates a new ChatOps handler
+func NewChatOpsHandler(chatops *service.ChatOpsService) *ChatOpsHandler {
+	return &ChatOpsHandler{chatops: chatops}
+}
+
+// ============== Integrations ==============
+
+// CreateIntegration creates a ChatOps integration
+func (h *ChatOpsHandler) CreateIntegration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateChatOpsIntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	integration, err := h.chatops.Create(userID, &req)
+	if err != nil {
+		respondWithChatOpsError(w, err, "Failed to create ChatOps integration")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, integration)
+}
+
+// ListIntegrations lists the user's ChatOps integrations
+func (h *ChatOpsHandler) ListIntegrations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	integrations, err := h.chatops.List(userID)
+	if err != nil {
+		respondWithChatOpsError(w, err, "Failed to fetch ChatOps integrations")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  integrations,
+		"total": len(integrations),
+	})
+}
+
+// GetIntegration gets a ChatOps integration
+func (h *ChatOpsHandler) GetIntegration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "integration")
+	if !ok {
+		return
+	}
+
+	integration, err := h.chatops.Get(userID, id)
+	if err != nil {
+		respondWithChatOpsError(w, err, "Failed to fetch ChatOps integration")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, integration)
+}
+
+// UpdateIntegration updates a ChatOps integration
+func (h *ChatOpsHandler) UpdateIntegration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "integration")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateChatOpsIntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	integration, err := h.chatops.Update(userID, id, &req)
+	if err != nil {
+		respondWithChatOpsError(w, err, "Failed to update ChatOps integration")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, integration)
+}
+
+// DeleteIntegration deletes a ChatOps integration and its chat account links
+func (h *ChatOpsHandler) DeleteIntegration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "integration")
+	if !ok {
+		return
+	}
+
+	if err := h.chatops.Delete(userID, id); err != nil {
+		respondWithChatOpsError(w, err, "Failed to delete ChatOps integration")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "ChatOps integration deleted successfully",
+	})
+}
+
+// ListIntegrationLinks lists the chat accounts linked through an integration
+// (GET /api/v1/chatops/integrations/{id}/links)
+func (h *ChatOpsHandler) ListIntegrationLinks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "integration")
+	if !ok {
+		return
+	}
+
+	links, err := h.chatops.IntegrationLinks(userID, id)
+	if err != nil {
+		respondWithChatOpsError(w, err, "Failed to fetch chat links")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  links,
+		"total": len(links),
+	})
+}
+
+// ============== Chat account links ==============
+
+// ConfirmLink links the chat account a link code was given to to the user
+func (h *ChatOpsHandler) ConfirmLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.ConfirmChatLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	link, err := h.chatops.ConfirmLink(userID, req.Code)
+	if err != nil {
+		respondWithChatOpsError(w, err, "Failed to link chat account")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, link)
+}
+
+// ListLinks lists the chat accounts linked to the user
+func (h *ChatOpsHandler) ListLinks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	links, err := h.chatops.Links(userID)
+	if err != nil {
+		respondWithChatOpsError(w, err, "Failed to fetch chat links")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  links,
+		"total": len(links),
+	})
+}
+
+// DeleteLink unlinks a chat account (DELETE /api/v1/chatops/links/{id})
+func (h *ChatOpsHandler) DeleteLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "link")
+	if !ok {
+		return
+	}
+
+	if err := h.chatops.Unlink(userID, id); err != nil {
+		respondWithChatOpsError(w, err, "Failed to unlink chat account")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Chat account unlinked successfully",
+	})
+}
+
+// ============== Inbound commands ==============
+
+// Inbound runs a command or button press sent by the chat system of an
+// integration (POST /api/v1/chatops/inbound/{id}). It is public; the request is
+// signed with the integration's secret, and answered in the chat system's format
+// rather than the API's.
+func (h *ChatOpsHandler) Inbound(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(w, r, 4, "integration")
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxChatRequestBytes))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	reply, err := h.chatops.HandleInbound(r.Context(), id, r.Header, body)
+	if err != nil {
+		respondWithChatOpsError(w, err, "Failed to run chat command")
+		return
+	}
+	if reply == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(reply)
+}
+
+// respondWithChatOpsError maps ChatOps service errors to responses
+func respondWithChatOpsError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidChatOpsIntegration):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrChatOpsIntegrationNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "ChatOps integration not found")
+	case errors.Is(err, service.ErrChatLinkNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Chat link not found, or the link code expired")
+	case errors.Is(err, service.ErrChatOpsUnauthorized):
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid request signature")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
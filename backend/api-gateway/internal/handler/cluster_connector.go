@@ -0,0 +1,184 @@
+// Package handler provides HTTP handlers for the in-cluster connector
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// ClusterConnectorHandler handles clusters onboarded through the in-cluster connector
+type ClusterConnectorHandler struct {
+	db         *gorm.DB
+	connectors *service.ClusterConnectorService
+}
+
+// NewClusterConnectorHandler creates a new cluster connector handler
+func NewClusterConnectorHandler(db *gorm.DB, connectors *service.ClusterConnectorService) *ClusterConnectorHandler {
+	return &ClusterConnectorHandler{db: db, connectors: connectors}
+}
+
+// CreateCluster adds a cluster that is reached through a connector and returns the
+// manifest installing it. With ?format=yaml only the manifest is returned.
+func (h *ClusterConnectorHandler) CreateCluster(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !enforceQuota(w, userID, model.QuotaResourceClusters, 1) {
+		return
+	}
+
+	var req model.CreateConnectorClusterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	manifest, err := h.connectors.Create(userID, &req, requestGatewayURL(r))
+	if err != nil {
+		respondWithConnectorError(w, err, "Failed to create cluster")
+		return
+	}
+	respondWithManifest(w, r, http.StatusCreated, manifest)
+}
+
+// GenerateManifest issues a new connector token and returns the manifest carrying
+// it. The previous token is revoked. With ?format=yaml only the manifest is returned.
+func (h *ClusterConnectorHandler) GenerateManifest(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	clusterID, ok := pathUUID(w, r, 3, "cluster")
+	if !ok {
+		return
+	}
+
+	var req model.ConnectorManifestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	manifest, err := h.connectors.Manifest(userID, clusterID, &req, requestGatewayURL(r))
+	if err != nil {
+		respondWithConnectorError(w, err, "Failed to generate connector manifest")
+		return
+	}
+	respondWithManifest(w, r, http.StatusOK, manifest)
+}
+
+// GetStatus returns the state of a cluster's connector tunnel
+func (h *ClusterConnectorHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	clusterID, ok := pathUUID(w, r, 3, "cluster")
+	if !ok {
+		return
+	}
+
+	status, err := h.connectors.Status(userID, clusterID)
+	if err != nil {
+		respondWithConnectorError(w, err, "Failed to fetch connector status")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": status,
+	})
+}
+
+// Connect is dialed by connectors. It authenticates the connector token, upgrades
+// the connection to the tunnel protocol and serves the tunnel until it drops.
+func (h *ClusterConnectorHandler) Connect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || !strings.EqualFold(r.Header.Get("Upgrade"), k8s.TunnelProtocol) {
+		respondWithError(w, http.StatusUpgradeRequired, "UPGRADE_REQUIRED", "Connect with Upgrade: "+k8s.TunnelProtocol)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	cluster, err := h.connectors.Authenticate(token)
+	if err != nil {
+		if errors.Is(err, service.ErrConnectorUnauthorized) {
+			respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid connector token")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to authenticate connector")
+		}
+		return
+	}
+
+	conn, buffered, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Connection cannot be upgraded")
+		return
+	}
+	// The server's read and write timeouts do not apply to the long-lived tunnel
+	conn.SetDeadline(time.Time{})
+	buffered.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: " + k8s.TunnelProtocol + "\r\n\r\n")
+	if err := buffered.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	h.connectors.Serve(r.Context(), cluster, &upgradedConn{Reader: buffered.Reader, Conn: conn},
+		r.Header.Get("X-Connector-Version"), r.RemoteAddr)
+}
+
+// upgradedConn reads through the buffer the server may already have filled
+type upgradedConn struct {
+	io.Reader
+	net.Conn
+}
+
+func (c *upgradedConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
+}
+
+// requestGatewayURL is the URL the request reached the gateway on, which
+// connectors dial unless told otherwise
+func requestGatewayURL(r *http.Request) string {
+	scheme := "http"
+	if isSecureRequest(r) {
+		scheme = "https"
+	}
+	host := r.Header.Get("X-Forwarded-Host")
+	if host == "" {
+		host = r.Host
+	}
+	return scheme + "://" + host
+}
+
+// respondWithManifest returns a connector manifest as JSON, or as YAML for ?format=yaml
+func respondWithManifest(w http.ResponseWriter, r *http.Request, status int, manifest *model.ConnectorManifestResponse) {
+	if r.URL.Query().Get("format") == "yaml" {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(status)
+		io.WriteString(w, manifest.Manifest)
+		return
+	}
+	respondWithJSON(w, status, map[string]interface{}{
+		"data": manifest,
+	})
+}
+
+// respondWithConnectorError maps cluster connector service errors to responses
+func respondWithConnectorError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidConnectorCluster):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrConnectorClusterNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found or not connected through a connector")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
@@ -0,0 +1,89 @@
+// Package handler provides HTTP handlers for cluster credential rotation
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// ClusterCredentialHandler handles the credentials of clusters reached with a kubeconfig
+type ClusterCredentialHandler struct {
+	db          *gorm.DB
+	credentials *service.ClusterCredentialService
+}
+
+// NewClusterCredentialHandler creates a new cluster credential handler
+func NewClusterCredentialHandler(db *gorm.DB, credentials *service.ClusterCredentialService) *ClusterCredentialHandler {
+	return &ClusterCredentialHandler{db: db, credentials: credentials}
+}
+
+// GetCredentials describes the credentials of a cluster's kubeconfig and when they expire
+func (h *ClusterCredentialHandler) GetCredentials(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	clusterID, ok := pathUUID(w, r, 3, "cluster")
+	if !ok {
+		return
+	}
+
+	status, err := h.credentials.Inspect(userID, clusterID)
+	if err != nil {
+		respondWithCredentialError(w, err, "Failed to inspect cluster credentials")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": status,
+	})
+}
+
+// RotateCredentials switches a cluster over to a new kubeconfig once it is verified
+// to reach the same cluster
+func (h *ClusterCredentialHandler) RotateCredentials(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	clusterID, ok := pathUUID(w, r, 3, "cluster")
+	if !ok {
+		return
+	}
+
+	var req model.RotateClusterCredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	status, err := h.credentials.Rotate(r.Context(), userID, clusterID, &req)
+	if err != nil {
+		respondWithCredentialError(w, err, "Failed to rotate cluster credentials")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":    status,
+		"message": "Cluster credentials rotated successfully",
+	})
+}
+
+// respondWithCredentialError maps cluster credential service errors to responses
+func respondWithCredentialError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidClusterCredentials):
+		respondWithError(w, http.StatusBadRequest, "INVALID_CONFIG", err.Error())
+	case errors.Is(err, service.ErrClusterCredentialsRejected):
+		respondWithError(w, http.StatusBadRequest, "CONNECTION_FAILED", err.Error())
+	case errors.Is(err, service.ErrClusterCredentialsMismatch):
+		respondWithError(w, http.StatusConflict, "CLUSTER_MISMATCH", "The new credentials reach a different cluster; set force to switch anyway")
+	case errors.Is(err, service.ErrClusterCredentialsNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found or not connected with a kubeconfig")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
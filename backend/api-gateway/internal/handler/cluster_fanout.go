@@ -0,0 +1,51 @@
+// Package handler provides HTTP handlers for queries across clusters
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// ClusterFanoutHandler handles workload and metrics queries run across clusters
+type ClusterFanoutHandler struct {
+	db     *gorm.DB
+	fanout *service.ClusterFanoutService
+}
+
+// NewClusterFanoutHandler creates a new cluster fan-out handler
+func NewClusterFanoutHandler(db *gorm.DB, fanout *service.ClusterFanoutService) *ClusterFanoutHandler {
+	return &ClusterFanoutHandler{db: db, fanout: fanout}
+}
+
+// Query runs a query on the selected clusters in parallel and returns the merged
+// items with the outcome on each cluster. Failed clusters do not fail the request.
+func (h *ClusterFanoutHandler) Query(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.ClusterFanoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	response, err := h.fanout.Query(r.Context(), userID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidFanoutQuery) {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to run fan-out query")
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": response,
+	})
+}
@@ -0,0 +1,99 @@
+// Package handler provides HTTP handlers for scoped cluster kubeconfigs
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// ClusterKubeconfigHandler issues users kubeconfigs limited to their permissions
+type ClusterKubeconfigHandler struct {
+	kubeconfigs *service.ClusterKubeconfigService
+}
+
+// NewClusterKubeconfigHandler creates a new cluster kubeconfig handler
+func NewClusterKubeconfigHandler(kubeconfigs *service.ClusterKubeconfigService) *ClusterKubeconfigHandler {
+	return &ClusterKubeconfigHandler{kubeconfigs: kubeconfigs}
+}
+
+// IssueKubeconfig issues a time-limited kubeconfig for the cluster carrying the
+// user's permissions (POST /api/v1/clusters/{id}/kubeconfig). With ?format=yaml
+// only the kubeconfig is returned, as a file.
+func (h *ClusterKubeconfigHandler) IssueKubeconfig(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	clusterID, ok := pathUUID(w, r, 3, "cluster")
+	if !ok {
+		return
+	}
+
+	var req model.IssueKubeconfigRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	kubeconfig, err := h.kubeconfigs.Issue(r.Context(), userID, clusterID, &req)
+	if err != nil {
+		respondWithKubeconfigError(w, err, "Failed to issue kubeconfig")
+		return
+	}
+
+	if r.URL.Query().Get("format") == "yaml" {
+		name := "kubeconfig-" + clusterID.String()[:8]
+		if req.Namespace != "" {
+			name += "-" + req.Namespace
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".yaml"))
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, kubeconfig.Kubeconfig)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, kubeconfig)
+}
+
+// RevokeKubeconfig invalidates the user's kubeconfigs for the cluster, or for
+// ?namespace of it (DELETE /api/v1/clusters/{id}/kubeconfig)
+func (h *ClusterKubeconfigHandler) RevokeKubeconfig(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	clusterID, ok := pathUUID(w, r, 3, "cluster")
+	if !ok {
+		return
+	}
+
+	if err := h.kubeconfigs.Revoke(r.Context(), userID, clusterID, r.URL.Query().Get("namespace")); err != nil {
+		respondWithKubeconfigError(w, err, "Failed to revoke kubeconfig")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Kubeconfig revoked successfully",
+	})
+}
+
+// respondWithKubeconfigError maps cluster kubeconfig service errors to responses
+func respondWithKubeconfigError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidKubeconfigRequest):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrKubeconfigClusterNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	case errors.Is(err, service.ErrNoKubeconfigPermissions):
+		respondWithError(w, http.StatusForbidden, "PERMISSION_DENIED", "You hold no permissions a kubeconfig can carry on this cluster or namespace")
+	case errors.Is(err, service.ErrKubeconfigIssueFailed):
+		respondWithError(w, http.StatusBadGateway, "CLUSTER_ERROR", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
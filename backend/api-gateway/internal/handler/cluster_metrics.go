@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
 	"github.com/wangjialin/myops/pkg/k8s"
 	"github.com/wangjialin/myops/pkg/model"
 	"gorm.io/gorm"
@@ -14,12 +15,21 @@ import (
 
 // ClusterMetricsHandler handles cluster metrics operations
 type ClusterMetricsHandler struct {
-	db *gorm.DB
+	db        *gorm.DB
+	collector *service.ClusterMetricsCollector
+	capacity  *service.CapacityService
 }
 
 // NewClusterMetricsHandler creates a new cluster metrics handler
-func NewClusterMetricsHandler(db *gorm.DB) *ClusterMetricsHandler {
-	return &ClusterMetricsHandler{db: db}
+func NewClusterMetricsHandler(db *gorm.DB, collector *service.ClusterMetricsCollector) *ClusterMetricsHandler {
+	if collector == nil {
+		collector = service.NewClusterMetricsCollector(db, nil, true)
+	}
+	return &ClusterMetricsHandler{
+		db:        db,
+		collector: collector,
+		capacity:  service.NewCapacityService(db),
+	}
 }
 
 // GetClusterMetrics handles cluster metrics retrieval requests
@@ -129,6 +139,15 @@ func (h *ClusterMetricsHandler) GetClusterMetricsSummary(w http.ResponseWriter,
 		return
 	}
 
+	summary := clusterMetricSummary(&metric)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": summary,
+	})
+}
+
+// clusterMetricSummary summarizes a metric snapshot of a cluster
+func clusterMetricSummary(metric *model.ClusterMetric) model.ClusterMetricSummary {
 	summary := model.ClusterMetricSummary{
 		Timestamp:        metric.Timestamp,
 		CPUUsagePercent:  metric.CPUUsagePercent,
@@ -138,15 +157,18 @@ func (h *ClusterMetricsHandler) GetClusterMetricsSummary(w http.ResponseWriter,
 		FailedPodCount:   metric.FailedPodCount,
 		NodeCount:        metric.NodeCount,
 		ReadyNodeCount:   metric.ReadyNodeCount,
+
+		KubeStateAvailable:         metric.KubeStateAvailable,
+		DeploymentCount:            metric.DeploymentCount,
+		UnavailableDeploymentCount: metric.UnavailableDeploymentCount,
+		CrashLoopPodCount:          metric.CrashLoopPodCount,
+		FailedJobCount:             metric.FailedJobCount,
 	}
 
 	if metric.MemoryTotalBytes > 0 {
 		summary.MemoryUsagePercent = (float64(metric.MemoryUsageBytes) / float64(metric.MemoryTotalBytes)) * 100
 	}
-
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"data": summary,
-	})
+	return summary
 }
 
 // GetNodeMetrics handles node metrics retrieval requests
@@ -260,19 +282,18 @@ func (h *ClusterMetricsHandler) GetLiveClusterMetrics(w http.ResponseWriter, r *
 	}
 	defer client.Close()
 
-	// Get live metrics (requires metrics server)
-	// For now, return cluster info without detailed metrics
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Read metrics directly from metrics.k8s.io, falling back to object counts
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	info, err := client.GetClusterInfo(ctx)
+	live, err := h.collector.ReadLive(ctx, client)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "FETCH_ERROR", "Failed to fetch cluster metrics")
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"data": info,
+		"data": live,
 	})
 }
 
@@ -325,7 +346,7 @@ func (h *ClusterMetricsHandler) GetLiveNodeMetrics(w http.ResponseWriter, r *htt
 	defer client.Close()
 
 	// Get nodes
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
 	nodes, err := client.GetNodes(ctx)
@@ -453,7 +474,7 @@ func (h *ClusterMetricsHandler) ListNamespaces(w http.ResponseWriter, r *http.Re
 	defer client.Close()
 
 	// Get namespaces
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
 	namespaces, err := client.GetNamespaces(ctx)
@@ -507,66 +528,13 @@ func (h *ClusterMetricsHandler) RefreshMetrics(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Trigger background metrics refresh
-	go h.collectMetrics(clusterID)
+	// Trigger background metrics refresh, which outlives the request but keeps its ID
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		_ = h.collector.CollectCluster(ctx, &cluster)
+	}()
 
 	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
 		"message": "Metrics refresh started",
 	})
 }
-
-// collectMetrics collects and stores metrics for a cluster
-func (h *ClusterMetricsHandler) collectMetrics(clusterID uuid.UUID) {
-	var cluster model.K8sCluster
-	if err := h.db.Where("id = ?", clusterID).First(&cluster).Error; err != nil {
-		return
-	}
-
-	config := &k8s.ClusterConfig{
-		Kubeconfig: []byte(cluster.Kubeconfig),
-		Endpoint:   cluster.Endpoint,
-	}
-
-	client, err := k8s.NewClusterClient(config)
-	if err != nil {
-		return
-	}
-	defer client.Close()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	// Get cluster info for basic metrics
-	info, err := client.GetClusterInfo(ctx)
-	if err != nil {
-		return
-	}
-
-	// Create cluster metric record
-	timestamp := time.Now().Unix()
-	clusterMetric := &model.ClusterMetric{
-		ID:              uuid.New(),
-		ClusterID:       clusterID,
-		Timestamp:       timestamp,
-		PodCount:        info.PodCount,
-		NodeCount:       info.NodeCount,
-	}
-
-	// Store metric (note: CPU/Memory usage requires metrics server which may not be installed)
-	h.db.Create(clusterMetric)
-
-	// Get and store node metrics
-	nodes, _ := client.GetNodes(ctx)
-	for _, node := range nodes {
-		nodeMetric := &model.NodeMetric{
-			ID:        uuid.New(),
-			ClusterID: clusterID,
-			NodeName:  node.Name,
-			Timestamp: timestamp,
-			Status:    node.Status,
-			Ready:     node.Status == "Ready",
-			PodCount:  0, // Will be calculated if we have pod info
-		}
-		h.db.Create(nodeMetric)
-	}
-}
@@ -0,0 +1,201 @@
+// Package handler provides HTTP handlers for Kubernetes RBAC inspection
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// ClusterRBACHandler inspects a managed cluster's own RBAC and generates roles for it
+type ClusterRBACHandler struct {
+	db *gorm.DB
+}
+
+// NewClusterRBACHandler creates a new cluster RBAC handler
+func NewClusterRBACHandler(db *gorm.DB) *ClusterRBACHandler {
+	return &ClusterRBACHandler{db: db}
+}
+
+// ListRBAC lists the Roles, ClusterRoles and their bindings. ?namespace limits the
+// Roles and RoleBindings to one namespace; ?includeSystem=true keeps system: objects.
+func (h *ClusterRBACHandler) ListRBAC(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.clusterClient(w, r)
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	query := r.URL.Query()
+	summary, err := client.ListRBAC(ctx, query.Get("namespace"), query.Get("includeSystem") == "true")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "FETCH_ERROR", err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": summary,
+	})
+}
+
+// WhoCan lists the subjects the cluster's bindings allow ?verb on ?resource, with the
+// optional ?group, ?subresource, ?name and ?namespace narrowing the action
+func (h *ClusterRBACHandler) WhoCan(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	attrs := &k8s.ResourceAttributes{
+		Verb:        query.Get("verb"),
+		Group:       query.Get("group"),
+		Resource:    query.Get("resource"),
+		Subresource: query.Get("subresource"),
+		Name:        query.Get("name"),
+		Namespace:   query.Get("namespace"),
+	}
+	if attrs.Verb == "" || attrs.Resource == "" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "verb and resource are required")
+		return
+	}
+
+	client, ok := h.clusterClient(w, r)
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	grants, err := client.WhoCan(ctx, attrs)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "FETCH_ERROR", err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  grants,
+		"total": len(grants),
+	})
+}
+
+// ReviewAccess asks the cluster whether a subject may perform an action, through
+// all of its authorizers rather than RBAC alone
+func (h *ClusterRBACHandler) ReviewAccess(w http.ResponseWriter, r *http.Request) {
+	var review k8s.AccessReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if review.Subject.Name == "" || review.Verb == "" || review.Resource == "" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "subject, verb and resource are required")
+		return
+	}
+
+	client, ok := h.clusterClient(w, r)
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	result, err := client.ReviewAccess(ctx, &review)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "REVIEW_FAILED", err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": result,
+	})
+}
+
+// GenerateRole renders a minimal Role and RoleBinding for the requested permissions
+// after checking the cluster serves the resources and verbs. With ?format=yaml only
+// the manifest is returned.
+func (h *ClusterRBACHandler) GenerateRole(w http.ResponseWriter, r *http.Request) {
+	var req k8s.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	manifest, err := k8s.GenerateRoleManifest(&req)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+
+	client, ok := h.clusterClient(w, r)
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	problems, err := client.ValidatePermissions(req.Permissions)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "FETCH_ERROR", err.Error())
+		return
+	}
+	if len(problems) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]interface{}{
+				"code":    "INVALID_PERMISSIONS",
+				"message": "The cluster does not serve some of the requested permissions",
+				"details": problems,
+			},
+			"requestId": responseRequestID(w),
+		})
+		return
+	}
+
+	if r.URL.Query().Get("format") == "yaml" {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, manifest)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"manifest": manifest,
+		},
+	})
+}
+
+// clusterClient connects to the cluster of the request. Cluster owners and users
+// holding clusters.get on the cluster may inspect its RBAC.
+func (h *ClusterRBACHandler) clusterClient(w http.ResponseWriter, r *http.Request) (*k8s.ClusterClient, bool) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return nil, false
+	}
+	clusterID, ok := pathUUID(w, r, 3, "cluster")
+	if !ok {
+		return nil, false
+	}
+
+	var cluster model.K8sCluster
+	if err := h.db.Where("id = ?", clusterID).First(&cluster).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+		return nil, false
+	}
+	if cluster.UserID != userID && !requirePermission(w, h.db, userID, "clusters", "get", &clusterID, "cluster") {
+		return nil, false
+	}
+
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "CLIENT_ERROR", "Failed to create cluster client")
+		return nil, false
+	}
+	return client, true
+}
@@ -5,11 +5,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"time"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/logging"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
 )
 
-// respondWithError sends an error response
+// respondWithError sends an error response, which the request log records
 func respondWithError(w http.ResponseWriter, status int, code, message string) {
+	logging.RecordError(w, code, message)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -17,7 +25,7 @@ func respondWithError(w http.ResponseWriter, status int, code, message string) {
 			"code":    code,
 			"message": message,
 		},
-		"requestId": generateRequestID(),
+		"requestId": responseRequestID(w),
 	})
 }
 
@@ -27,11 +35,67 @@ func respondWithJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"data":      data,
-		"requestId": generateRequestID(),
+		"requestId": responseRequestID(w),
 	})
 }
 
-// generateRequestID generates a unique request ID
-func generateRequestID() string {
-	return fmt.Sprintf("req-%d", time.Now().UnixNano())
+// requirePermission checks an RBAC permission for the user and sends a 403 response if it is denied
+func requirePermission(w http.ResponseWriter, db *gorm.DB, userID uuid.UUID, resource, action string, resourceID *uuid.UUID, resourceType string) bool {
+	result := model.UserHasPermission(db, userID, resource, action, resourceID, resourceType)
+	if !result.Allowed {
+		respondWithError(w, http.StatusForbidden, "PERMISSION_DENIED", fmt.Sprintf("Permission %s.%s required", resource, action))
+		return false
+	}
+	return true
+}
+
+// requireFeature checks that a feature flag is on for the user and sends a 403
+// response if it is off
+func requireFeature(w http.ResponseWriter, flags *service.FeatureFlagService, userID uuid.UUID, key string) bool {
+	if !flags.IsEnabled(userID, key) {
+		respondWithError(w, http.StatusForbidden, "FEATURE_DISABLED", fmt.Sprintf("Feature %s is not enabled", key))
+		return false
+	}
+	return true
+}
+
+// pageParams reads the page and pageSize query parameters, defaulting to the
+// first page of 20 and capping the size at 100
+func pageParams(r *http.Request) (page, pageSize int) {
+	page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ = strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
+
+// queryUUID reads an optional UUID query parameter, ignoring malformed values
+func queryUUID(r *http.Request, name string) *uuid.UUID {
+	id, err := uuid.Parse(r.URL.Query().Get(name))
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
+// tagSelectorParam reads the tags query parameter of a list, a selector over the
+// tags of the listed resources such as env=prod,team in (payments), and sends a
+// 400 response if it is invalid
+func tagSelectorParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	selector := r.URL.Query().Get("tags")
+	if _, err := db.ParseTagSelector(selector); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_SELECTOR", err.Error())
+		return "", false
+	}
+	return selector, true
+}
+
+// responseRequestID returns the correlation ID of the request a response is
+// written for
+func responseRequestID(w http.ResponseWriter) string {
+	return logging.ResponseRequestID(w)
 }
@@ -0,0 +1,373 @@
+// Package handler provides HTTP handlers for compliance scans, reports and schedules
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// defaultComplianceTrendWindow is how far back a trend goes without ?since
+const defaultComplianceTrendWindow = 90 * 24 * time.Hour
+
+// ComplianceHandler handles CIS benchmark scans of hosts and clusters
+type ComplianceHandler struct {
+	db         *gorm.DB
+	compliance *service.ComplianceService
+}
+
+// NewComplianceHandler creates a new compliance handler
+func NewComplianceHandler(db *gorm.DB, compliance *service.ComplianceService) *ComplianceHandler {
+	return &ComplianceHandler{db: db, compliance: compliance}
+}
+
+// ListChecks lists the checks scans evaluate, optionally only those of ?targetType
+func (h *ComplianceHandler) ListChecks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "compliance", "view", nil, "") {
+		return
+	}
+
+	checks := h.compliance.Checks(model.ComplianceTargetType(r.URL.Query().Get("targetType")))
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  checks,
+		"total": len(checks),
+	})
+}
+
+// RunScan scans a host or cluster and returns its report
+func (h *ComplianceHandler) RunScan(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "compliance", "run", nil, "") {
+		return
+	}
+
+	var req model.RunComplianceScanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	report, err := h.compliance.Scan(r.Context(), userID, &req)
+	if err != nil {
+		respondWithComplianceError(w, err, "Failed to run compliance scan")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": report,
+	})
+}
+
+// ListReports lists reports with optional targetType, targetId, scheduleId,
+// status, since and until filters and page/pageSize
+func (h *ComplianceHandler) ListReports(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "compliance", "view", nil, "") {
+		return
+	}
+
+	params := r.URL.Query()
+	filter := model.ComplianceReportFilter{
+		TargetType: model.ComplianceTargetType(params.Get("targetType")),
+		Status:     model.ComplianceReportStatus(params.Get("status")),
+	}
+	for name, target := range map[string]**uuid.UUID{"targetId": &filter.TargetID, "scheduleId": &filter.ScheduleID} {
+		if v := params.Get(name); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid "+name+" format")
+				return
+			}
+			*target = &id
+		}
+	}
+	var err error
+	if filter.Since, err = parseQueryTime(params.Get("since")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid since time")
+		return
+	}
+	if filter.Until, err = parseQueryTime(params.Get("until")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid until time")
+		return
+	}
+
+	page := 1
+	pageSize := 50
+	if p, err := strconv.Atoi(params.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if ps, err := strconv.Atoi(params.Get("pageSize")); err == nil && ps > 0 && ps <= 500 {
+		pageSize = ps
+	}
+	filter.Limit = pageSize
+	filter.Offset = (page - 1) * pageSize
+
+	reports, total, err := h.compliance.Reports(&filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch compliance reports")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":       reports,
+		"total":      total,
+		"page":       page,
+		"pageSize":   pageSize,
+		"totalPages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// GetReport gets a report with its check results
+func (h *ComplianceHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "compliance", "view", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "compliance report")
+	if !ok {
+		return
+	}
+
+	report, err := h.compliance.Report(id)
+	if err != nil {
+		respondWithComplianceError(w, err, "Failed to fetch compliance report")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": report,
+	})
+}
+
+// ExportReport downloads a report as ?format=csv (the default) or pdf
+func (h *ComplianceHandler) ExportReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "compliance", "view", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "compliance report")
+	if !ok {
+		return
+	}
+
+	report, err := h.compliance.Report(id)
+	if err != nil {
+		respondWithComplianceError(w, err, "Failed to fetch compliance report")
+		return
+	}
+
+	var data []byte
+	var contentType string
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", "csv":
+		format, contentType = "csv", "text/csv"
+		if data, err = service.ExportComplianceCSV(report); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to export compliance report")
+			return
+		}
+	case "pdf":
+		contentType = "application/pdf"
+		data = service.ExportCompliancePDF(report)
+	default:
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "format must be csv or pdf")
+		return
+	}
+
+	filename := fmt.Sprintf("compliance-%s-%s.%s", report.TargetName, report.CreatedAt.Format("20060102-150405"), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// GetTrend lists the scores of a target's scans, oldest first. ?targetType and
+// ?targetId are required; ?since defaults to 90 days ago.
+func (h *ComplianceHandler) GetTrend(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "compliance", "view", nil, "") {
+		return
+	}
+
+	params := r.URL.Query()
+	targetID, err := uuid.Parse(params.Get("targetId"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid targetId format")
+		return
+	}
+	since, err := parseQueryTime(params.Get("since"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid since time")
+		return
+	}
+	if since.IsZero() {
+		since = time.Now().Add(-defaultComplianceTrendWindow)
+	}
+
+	points, err := h.compliance.Trend(model.ComplianceTargetType(params.Get("targetType")), targetID, since)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch compliance trend")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": points,
+	})
+}
+
+// ListSchedules lists the scan schedules
+func (h *ComplianceHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "compliance", "view", nil, "") {
+		return
+	}
+
+	schedules, err := h.compliance.ListSchedules()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch compliance schedules")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  schedules,
+		"total": len(schedules),
+	})
+}
+
+// CreateSchedule adds a schedule that scans hosts or clusters periodically
+func (h *ComplianceHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "compliance", "manage", nil, "") {
+		return
+	}
+
+	var req model.CreateComplianceScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	schedule, err := h.compliance.CreateSchedule(userID, &req)
+	if err != nil {
+		respondWithComplianceError(w, err, "Failed to create compliance schedule")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, schedule)
+}
+
+// GetSchedule gets a scan schedule
+func (h *ComplianceHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "compliance", "view", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "compliance schedule")
+	if !ok {
+		return
+	}
+
+	schedule, err := h.compliance.GetSchedule(id)
+	if err != nil {
+		respondWithComplianceError(w, err, "Failed to fetch compliance schedule")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, schedule)
+}
+
+// UpdateSchedule changes a scan schedule
+func (h *ComplianceHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "compliance", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "compliance schedule")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateComplianceScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	schedule, err := h.compliance.UpdateSchedule(id, &req)
+	if err != nil {
+		respondWithComplianceError(w, err, "Failed to update compliance schedule")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, schedule)
+}
+
+// DeleteSchedule removes a scan schedule
+func (h *ComplianceHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "compliance", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "compliance schedule")
+	if !ok {
+		return
+	}
+
+	if err := h.compliance.DeleteSchedule(id); err != nil {
+		respondWithComplianceError(w, err, "Failed to delete compliance schedule")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Compliance schedule deleted successfully",
+	})
+}
+
+// respondWithComplianceError maps compliance service errors to responses
+func respondWithComplianceError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidComplianceTarget), errors.Is(err, service.ErrInvalidComplianceSchedule):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrComplianceTargetNotFound):
+		respondWithError(w, http.StatusNotFound, "TARGET_NOT_FOUND", "Host or cluster not found")
+	case errors.Is(err, service.ErrComplianceReportNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Compliance report not found")
+	case errors.Is(err, service.ErrComplianceScheduleNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Compliance schedule not found")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
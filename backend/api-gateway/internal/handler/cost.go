@@ -0,0 +1,190 @@
+// Package handler provides HTTP handlers for cluster cost attribution
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// maxCostTrendMonths bounds the months returned by the trend report
+const maxCostTrendMonths = 24
+
+// CostHandler handles cluster cost operations
+type CostHandler struct {
+	db    *gorm.DB
+	costs *service.CostService
+}
+
+// NewCostHandler creates a new cost handler
+func NewCostHandler(db *gorm.DB, costs *service.CostService) *CostHandler {
+	return &CostHandler{db: db, costs: costs}
+}
+
+// GetClusterCosts handles cost attribution requests.
+// Query parameters: duration (default 24h), groupBy (namespace or label), label, basis.
+func (h *CostHandler) GetClusterCosts(w http.ResponseWriter, r *http.Request) {
+	cluster, ok := h.ownedCluster(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	duration := 24 * time.Hour
+	if durationStr := query.Get("duration"); durationStr != "" {
+		d, err := time.ParseDuration(durationStr)
+		if err != nil || d <= 0 {
+			respondWithError(w, http.StatusBadRequest, "INVALID_DURATION", "Invalid duration format")
+			return
+		}
+		duration = d
+	}
+
+	groupBy := service.CostGroupNamespace
+	switch query.Get("groupBy") {
+	case "", service.CostGroupNamespace:
+	case "label":
+		if query.Get("label") == "" {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "label is required when grouping by label")
+			return
+		}
+		groupBy = "label:" + query.Get("label")
+	default:
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "groupBy must be namespace or label")
+		return
+	}
+
+	basis := model.CostBasis(query.Get("basis"))
+	if basis != "" && !basis.IsValid() {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "basis must be requests, usage or max")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	end := time.Now()
+	report, err := h.costs.Costs(ctx, cluster, end.Add(-duration), end, groupBy, basis)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to compute cluster costs")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": report,
+	})
+}
+
+// GetCostTrend handles monthly cost trend requests
+func (h *CostHandler) GetCostTrend(w http.ResponseWriter, r *http.Request) {
+	cluster, ok := h.ownedCluster(w, r)
+	if !ok {
+		return
+	}
+
+	months := 6
+	if monthsStr := r.URL.Query().Get("months"); monthsStr != "" {
+		m, err := strconv.Atoi(monthsStr)
+		if err != nil || m < 1 || m > maxCostTrendMonths {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "months must be between 1 and 24")
+			return
+		}
+		months = m
+	}
+
+	report, err := h.costs.Trend(cluster.ID, months)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to compute cost trend")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": report,
+	})
+}
+
+// GetPricing handles cluster pricing retrieval requests
+func (h *CostHandler) GetPricing(w http.ResponseWriter, r *http.Request) {
+	cluster, ok := h.ownedCluster(w, r)
+	if !ok {
+		return
+	}
+
+	pricing, err := h.costs.Pricing(cluster.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve pricing")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": pricing,
+	})
+}
+
+// UpdatePricing handles cluster pricing update requests
+func (h *CostHandler) UpdatePricing(w http.ResponseWriter, r *http.Request) {
+	cluster, ok := h.ownedCluster(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.UpdateClusterPricingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	pricing, err := h.costs.UpdatePricing(cluster.ID, &req)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PRICING", err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": pricing,
+	})
+}
+
+// ownedCluster resolves the cluster in the URL path and checks that the user owns it
+func (h *CostHandler) ownedCluster(w http.ResponseWriter, r *http.Request) (*model.K8sCluster, bool) {
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) < 5 || pathParts[4] != "costs" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return nil, false
+	}
+
+	clusterID, err := uuid.Parse(pathParts[3])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_CLUSTER_ID", "Invalid cluster ID")
+		return nil, false
+	}
+
+	// Get user ID from context
+	var userID uuid.UUID
+	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
+		if uid, ok := userIDVal.(string); ok {
+			userID, _ = uuid.Parse(uid)
+		}
+	}
+
+	if userID == (uuid.UUID{}) {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return nil, false
+	}
+
+	// Verify cluster ownership
+	var cluster model.K8sCluster
+	if err := h.db.Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+		return nil, false
+	}
+
+	return &cluster, true
+}
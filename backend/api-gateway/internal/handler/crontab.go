@@ -0,0 +1,363 @@
+// Package handler provides HTTP handlers for host crontab and systemd timer management
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// crontabUserPattern matches valid system user names
+var crontabUserPattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// previewExecutions is the number of upcoming executions returned by previews
+const previewExecutions = 5
+
+// GetCrontab lists a user's crontab entries and the host's systemd timers
+// (GET /api/v1/hosts/{id}/crontab?user=root)
+func (h *ProcessManagementHandler) GetCrontab(w http.ResponseWriter, r *http.Request) {
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) != 5 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+
+	crontabUser, ok := parseCrontabUser(w, r.URL.Query().Get("user"))
+	if !ok {
+		return
+	}
+
+	host, userID, ok := h.agentHost(w, r, pathParts[3], "services")
+	if !ok {
+		return
+	}
+
+	content, err := h.readCrontab(r, host, userID, crontabUser)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "CRONTAB_READ_FAILED", fmt.Sprintf("Failed to read crontab: %v", err))
+		return
+	}
+
+	// Hosts without systemd simply have no timers
+	timers := []model.SystemdTimer{}
+	if output, err := h.runOnAgent(r, host, userID, model.AgentCommandTimerList, nil); err == nil {
+		json.Unmarshal([]byte(output), &timers)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": model.CrontabResponse{
+			User:    crontabUser,
+			Entries: service.ParseCrontab(content),
+			Timers:  timers,
+		},
+	})
+}
+
+// ValidateSchedule checks a cron schedule or OnCalendar expression and previews its next executions
+// (POST /api/v1/hosts/{id}/crontab/validate)
+func (h *ProcessManagementHandler) ValidateSchedule(w http.ResponseWriter, r *http.Request) {
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) != 6 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+
+	var req model.ValidateScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if (req.Schedule == "") == (req.Calendar == "") {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Exactly one of schedule or calendar is required")
+		return
+	}
+
+	// Cron schedules are evaluated locally
+	if req.Schedule != "" {
+		// Get user ID from context
+		var userID uuid.UUID
+		if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
+			if uid, ok := userIDVal.(string); ok {
+				userID, _ = uuid.Parse(uid)
+			}
+		}
+
+		if userID == (uuid.UUID{}) {
+			respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"data": cronValidation(req.Schedule),
+		})
+		return
+	}
+
+	// OnCalendar expressions are evaluated by systemd on the host
+	host, userID, ok := h.agentHost(w, r, pathParts[3], "services")
+	if !ok {
+		return
+	}
+
+	result := model.ScheduleValidationResponse{Valid: true, NextExecutions: []string{}}
+	args := map[string]interface{}{"expression": req.Calendar, "iterations": previewExecutions}
+	output, err := h.runOnAgent(r, host, userID, model.AgentCommandCalendarPreview, args)
+	if err != nil {
+		result.Valid = false
+		result.Error = err.Error()
+	} else if err := json.Unmarshal([]byte(output), &result.NextExecutions); err != nil {
+		respondWithError(w, http.StatusBadGateway, "INVALID_AGENT_RESPONSE", "Agent returned an invalid preview")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": result,
+	})
+}
+
+// CreateCrontabEntry adds a job to a user's crontab
+// (POST /api/v1/hosts/{id}/crontab)
+func (h *ProcessManagementHandler) CreateCrontabEntry(w http.ResponseWriter, r *http.Request) {
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) != 5 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+
+	h.writeCrontabEntry(w, r, pathParts[3], "")
+}
+
+// UpdateCrontabEntry replaces a job in a user's crontab
+// (PUT /api/v1/hosts/{id}/crontab/{entryId})
+func (h *ProcessManagementHandler) UpdateCrontabEntry(w http.ResponseWriter, r *http.Request) {
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) != 6 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+
+	h.writeCrontabEntry(w, r, pathParts[3], pathParts[5])
+}
+
+// DeleteCrontabEntry removes a job from a user's crontab
+// (DELETE /api/v1/hosts/{id}/crontab/{entryId}?user=root)
+func (h *ProcessManagementHandler) DeleteCrontabEntry(w http.ResponseWriter, r *http.Request) {
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) != 6 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+	entryID := pathParts[5]
+
+	crontabUser, ok := parseCrontabUser(w, r.URL.Query().Get("user"))
+	if !ok {
+		return
+	}
+
+	host, userID, ok := h.agentHost(w, r, pathParts[3], "services")
+	if !ok {
+		return
+	}
+
+	content, err := h.readCrontab(r, host, userID, crontabUser)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "CRONTAB_READ_FAILED", fmt.Sprintf("Failed to read crontab: %v", err))
+		return
+	}
+
+	oldLine := crontabEntryLine(content, entryID)
+	updated, err := service.ReplaceCrontabEntry(content, entryID, "")
+	if err == service.ErrCrontabEntryNotFound {
+		respondWithError(w, http.StatusConflict, "ENTRY_NOT_FOUND", "Crontab entry not found; the crontab may have changed")
+		return
+	}
+
+	if err := h.writeCrontab(r, host, userID, crontabUser, updated); err != nil {
+		respondWithError(w, http.StatusBadGateway, "CRONTAB_WRITE_FAILED", fmt.Sprintf("Failed to write crontab: %v", err))
+		return
+	}
+
+	h.auditCrontab(r, userID, host.ID, "crontab.delete", crontabUser, oldLine, "")
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Crontab entry deleted",
+	})
+}
+
+// writeCrontabEntry creates (entryID == "") or replaces an entry, or previews the change on dry run
+func (h *ProcessManagementHandler) writeCrontabEntry(w http.ResponseWriter, r *http.Request, hostIDStr, entryID string) {
+	var req model.CrontabEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	crontabUser, ok := parseCrontabUser(w, req.User)
+	if !ok {
+		return
+	}
+
+	validation := cronValidation(req.Schedule)
+	if !validation.Valid {
+		respondWithError(w, http.StatusBadRequest, "INVALID_SCHEDULE", validation.Error)
+		return
+	}
+	if strings.TrimSpace(req.Command) == "" || strings.ContainsAny(req.Command, "\r\n") {
+		respondWithError(w, http.StatusBadRequest, "INVALID_COMMAND", "Command must be a single non-empty line")
+		return
+	}
+
+	host, userID, ok := h.agentHost(w, r, hostIDStr, "services")
+	if !ok {
+		return
+	}
+
+	content, err := h.readCrontab(r, host, userID, crontabUser)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "CRONTAB_READ_FAILED", fmt.Sprintf("Failed to read crontab: %v", err))
+		return
+	}
+
+	line := service.FormatCrontabEntry(req.Schedule, req.Command, req.Disabled)
+	action := "crontab.create"
+	oldLine := ""
+	var updated string
+	if entryID == "" {
+		updated = service.AddCrontabEntry(content, line)
+	} else {
+		action = "crontab.update"
+		oldLine = crontabEntryLine(content, entryID)
+		updated, err = service.ReplaceCrontabEntry(content, entryID, line)
+		if err == service.ErrCrontabEntryNotFound {
+			respondWithError(w, http.StatusConflict, "ENTRY_NOT_FOUND", "Crontab entry not found; the crontab may have changed")
+			return
+		}
+	}
+
+	response := map[string]interface{}{
+		"dryRun":         req.DryRun,
+		"nextExecutions": validation.NextExecutions,
+	}
+	for _, entry := range service.ParseCrontab(line) {
+		response["entry"] = entry
+	}
+
+	if req.DryRun {
+		response["crontab"] = updated
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"data": response,
+		})
+		return
+	}
+
+	if err := h.writeCrontab(r, host, userID, crontabUser, updated); err != nil {
+		respondWithError(w, http.StatusBadGateway, "CRONTAB_WRITE_FAILED", fmt.Sprintf("Failed to write crontab: %v", err))
+		return
+	}
+
+	h.auditCrontab(r, userID, host.ID, action, crontabUser, oldLine, line)
+
+	status := http.StatusOK
+	if entryID == "" {
+		status = http.StatusCreated
+	}
+	respondWithJSON(w, status, map[string]interface{}{
+		"data": response,
+	})
+}
+
+// readCrontab returns the raw crontab content of a user on the host
+func (h *ProcessManagementHandler) readCrontab(r *http.Request, host *model.Host, userID uuid.UUID, crontabUser string) (string, error) {
+	output, err := h.runOnAgent(r, host, userID, model.AgentCommandCrontabRead, map[string]string{"user": crontabUser})
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		return "", fmt.Errorf("invalid agent response: %w", err)
+	}
+	return result.Content, nil
+}
+
+// writeCrontab installs new crontab content for a user on the host
+func (h *ProcessManagementHandler) writeCrontab(r *http.Request, host *model.Host, userID uuid.UUID, crontabUser, content string) error {
+	args := map[string]string{"user": crontabUser, "content": content}
+	_, err := h.runOnAgent(r, host, userID, model.AgentCommandCrontabWrite, args)
+	return err
+}
+
+// auditCrontab records a crontab change with the previous and new entry lines
+func (h *ProcessManagementHandler) auditCrontab(r *http.Request, userID, hostID uuid.UUID, action, crontabUser, oldLine, newLine string) {
+	username, _ := r.Context().Value("username").(string)
+	h.db.Create(&model.AuditLog{
+		ID:         uuid.New(),
+		UserID:     userID,
+		Username:   username,
+		Action:     action,
+		Resource:   "hosts",
+		ResourceID: hostID.String(),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		IPAddress:  r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+		StatusCode: http.StatusOK,
+		OldValue:   crontabAuditValue(crontabUser, oldLine),
+		NewValue:   crontabAuditValue(crontabUser, newLine),
+	})
+}
+
+// crontabAuditValue encodes an entry line for the audit log
+func crontabAuditValue(crontabUser, line string) string {
+	if line == "" {
+		return ""
+	}
+	data, _ := json.Marshal(map[string]string{"user": crontabUser, "line": line})
+	return string(data)
+}
+
+// crontabEntryLine returns the raw line of the entry with the given ID
+func crontabEntryLine(content, entryID string) string {
+	lines := strings.Split(content, "\n")
+	for _, entry := range service.ParseCrontab(content) {
+		if entry.ID == entryID {
+			return strings.TrimSpace(lines[entry.Line-1])
+		}
+	}
+	return ""
+}
+
+// cronValidation validates a cron schedule and previews its next executions in UTC
+func cronValidation(schedule string) model.ScheduleValidationResponse {
+	times, err := service.NextCronExecutions(schedule, time.Now().UTC(), previewExecutions)
+	if err != nil {
+		return model.ScheduleValidationResponse{Valid: false, Error: err.Error(), NextExecutions: []string{}}
+	}
+
+	next := make([]string, len(times))
+	for i, t := range times {
+		next[i] = t.Format(time.RFC3339)
+	}
+	return model.ScheduleValidationResponse{Valid: true, NextExecutions: next}
+}
+
+// parseCrontabUser validates the crontab owner, defaulting to root
+func parseCrontabUser(w http.ResponseWriter, crontabUser string) (string, bool) {
+	if crontabUser == "" {
+		return "root", true
+	}
+	if !crontabUserPattern.MatchString(crontabUser) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_USER", "Invalid crontab user")
+		return "", false
+	}
+	return crontabUser, true
+}
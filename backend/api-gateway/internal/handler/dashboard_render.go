@@ -0,0 +1,109 @@
+// Package handler provides HTTP handlers for rendering Prometheus dashboards
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// RenderDashboard runs the panel queries of a dashboard server-side and returns
+// their series on one time grid. It serves /api/v1/prometheus/dashboards/{id}/render
+// and /api/v1/prometheus/dashboards/{id}/panels/{panelId}/render, with the start
+// and end query parameters as RFC 3339 or unix seconds, an optional step and
+// var-{name} parameters overriding template variables.
+func (h *PrometheusHandler) RenderDashboard(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	dashboardID, ok := pathUUID(w, r, 4, "dashboard")
+	if !ok {
+		return
+	}
+
+	req, ok := dashboardRenderRequest(w, r)
+	if !ok {
+		return
+	}
+	if parts := splitPath(r.URL.Path); len(parts) == 8 {
+		req.PanelID = parts[6]
+	}
+
+	result, err := h.renderer.Render(r.Context(), userID, dashboardID, req)
+	if err != nil {
+		respondWithDashboardRenderError(w, err, "Failed to render dashboard")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// GetDashboardVariables resolves the options and selections of a dashboard's
+// template variables (GET /api/v1/prometheus/dashboards/{id}/variables), with the
+// same time range and var-{name} parameters as RenderDashboard
+func (h *PrometheusHandler) GetDashboardVariables(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	dashboardID, ok := pathUUID(w, r, 4, "dashboard")
+	if !ok {
+		return
+	}
+	req, ok := dashboardRenderRequest(w, r)
+	if !ok {
+		return
+	}
+
+	variables, err := h.renderer.Variables(r.Context(), userID, dashboardID, req)
+	if err != nil {
+		respondWithDashboardRenderError(w, err, "Failed to resolve dashboard variables")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": variables,
+	})
+}
+
+// dashboardRenderRequest reads the time range, step and variable overrides of a
+// render from the query parameters; several values of a variable are joined as
+// a regex alternation
+func dashboardRenderRequest(w http.ResponseWriter, r *http.Request) (*model.DashboardRenderRequest, bool) {
+	params := r.URL.Query()
+	req := &model.DashboardRenderRequest{Step: params.Get("step")}
+	for key, values := range params {
+		if name, ok := strings.CutPrefix(key, "var-"); ok && name != "" {
+			if req.Variables == nil {
+				req.Variables = make(map[string]string)
+			}
+			req.Variables[name] = strings.Join(values, "|")
+		}
+	}
+	var err error
+	if req.Start, err = parseQueryTime(params.Get("start")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid start time")
+		return nil, false
+	}
+	if req.End, err = parseQueryTime(params.Get("end")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid end time")
+		return nil, false
+	}
+	return req, true
+}
+
+// respondWithDashboardRenderError maps dashboard render service errors to responses
+func respondWithDashboardRenderError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidDashboardRender):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrDashboardNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Dashboard not found")
+	case errors.Is(err, service.ErrDashboardPanelNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Panel not found")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
@@ -0,0 +1,163 @@
+// Package handler provides HTTP handlers for public dashboard share links
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// DashboardShareHandler handles public share links to Prometheus dashboards
+type DashboardShareHandler struct {
+	db     *gorm.DB
+	shares *service.DashboardShareService
+}
+
+// NewDashboardShareHandler creates a new dashboard share handler
+func NewDashboardShareHandler(db *gorm.DB, shares *service.DashboardShareService) *DashboardShareHandler {
+	return &DashboardShareHandler{db: db, shares: shares}
+}
+
+// respondWithShareError sends the status of a share link error
+func respondWithShareError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidShareLink):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrDashboardNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Dashboard not found")
+	case errors.Is(err, service.ErrShareLinkNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Share link not found")
+	case errors.Is(err, service.ErrShareLinkExpired):
+		respondWithError(w, http.StatusGone, "SHARE_LINK_EXPIRED", "Share link has expired or was revoked")
+	case errors.Is(err, service.ErrShareLinkRateLimited):
+		respondWithError(w, http.StatusTooManyRequests, "RATE_LIMIT_EXCEEDED", "Too many requests")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
+
+// CreateShareLink creates a public link to the dashboard in the path
+func (h *DashboardShareHandler) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	// /api/v1/prometheus/dashboards/{id}/share-links
+	dashboardID, ok := pathUUID(w, r, 4, "dashboard")
+	if !ok {
+		return
+	}
+
+	var req model.CreateDashboardShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	result, err := h.shares.Create(r.Context(), userID, dashboardID, &req)
+	if err != nil {
+		respondWithShareError(w, err, "Failed to create share link")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, result)
+}
+
+// ListShareLinks lists the share links of the dashboard in the path
+func (h *DashboardShareHandler) ListShareLinks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	dashboardID, ok := pathUUID(w, r, 4, "dashboard")
+	if !ok {
+		return
+	}
+
+	links, err := h.shares.List(userID, dashboardID)
+	if err != nil {
+		respondWithShareError(w, err, "Failed to list share links")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  links,
+		"total": len(links),
+	})
+}
+
+// RevokeShareLink revokes a share link of the dashboard in the path
+func (h *DashboardShareHandler) RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	// /api/v1/prometheus/dashboards/{id}/share-links/{linkId}
+	dashboardID, ok := pathUUID(w, r, 4, "dashboard")
+	if !ok {
+		return
+	}
+	linkID, ok := pathUUID(w, r, 6, "share link")
+	if !ok {
+		return
+	}
+
+	if err := h.shares.Revoke(userID, dashboardID, linkID); err != nil {
+		respondWithShareError(w, err, "Failed to revoke share link")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Share link revoked successfully",
+	})
+}
+
+// ListShareLinkAccesses lists the recent attempts to open a share link
+func (h *DashboardShareHandler) ListShareLinkAccesses(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	// /api/v1/prometheus/dashboards/{id}/share-links/{linkId}/accesses
+	dashboardID, ok := pathUUID(w, r, 4, "dashboard")
+	if !ok {
+		return
+	}
+	linkID, ok := pathUUID(w, r, 6, "share link")
+	if !ok {
+		return
+	}
+
+	accesses, err := h.shares.Accesses(userID, dashboardID, linkID)
+	if err != nil {
+		respondWithShareError(w, err, "Failed to list share link accesses")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  accesses,
+		"total": len(accesses),
+	})
+}
+
+// ViewSharedDashboard serves /api/v1/public/dashboards/{token} without authentication
+func (h *DashboardShareHandler) ViewSharedDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	token := strings.TrimPrefix(r.URL.Path, "/api/v1/public/dashboards/")
+	if token == "" || strings.Contains(token, "/") {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Share link not found")
+		return
+	}
+
+	shared, err := h.shares.View(r.Context(), token, r.RemoteAddr, r.UserAgent())
+	if err != nil {
+		respondWithShareError(w, err, "Failed to load shared dashboard")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, shared)
+}
@@ -0,0 +1,178 @@
+// Package handler provides HTTP handlers for raw data exports
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// dataExportPermissions are the permissions, beyond reports.export, needed to
+// export each dataset
+var dataExportPermissions = map[model.DataExportDataset][2]string{
+	model.DataExportHosts:          {"hosts", "list"},
+	model.DataExportHostMetrics:    {"hosts", "list"},
+	model.DataExportClusterMetrics: {"clusters", "list"},
+	model.DataExportAlerts:         {"alerts", "list"},
+}
+
+// DataExportHandler handles exports of hosts, metrics and alerts as CSV or Parquet
+type DataExportHandler struct {
+	db      *gorm.DB
+	exports *service.DataExportService
+}
+
+// NewDataExportHandler creates a new data export handler
+func NewDataExportHandler(db *gorm.DB, exports *service.DataExportService) *DataExportHandler {
+	return &DataExportHandler{db: db, exports: exports}
+}
+
+// CreateExport queues an export of a dataset; it can be downloaded through
+// its signed link once generated (POST /api/v1/data-exports)
+func (h *DataExportHandler) CreateExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "export", nil, "") {
+		return
+	}
+
+	var req model.CreateDataExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if permission, ok := dataExportPermissions[req.Dataset]; ok {
+		if !requirePermission(w, h.db, userID, permission[0], permission[1], nil, "") {
+			return
+		}
+	}
+
+	export, err := h.exports.Create(userID, &req)
+	if err != nil {
+		respondWithDataExportError(w, err, "Failed to queue data export")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, export)
+}
+
+// ListExports lists the user's exports with page/pageSize
+func (h *DataExportHandler) ListExports(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "export", nil, "") {
+		return
+	}
+
+	page, pageSize := pageParams(r)
+	exports, total, err := h.exports.List(userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch data exports")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":     exports,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// GetExport gets one of the user's exports with a fresh download link once it
+// is generated (GET /api/v1/data-exports/{id})
+func (h *DataExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "export", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "data export")
+	if !ok {
+		return
+	}
+
+	export, err := h.exports.Get(userID, id)
+	if err != nil {
+		respondWithDataExportError(w, err, "Failed to fetch data export")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, export)
+}
+
+// DeleteExport deletes one of the user's exports (DELETE /api/v1/data-exports/{id})
+func (h *DataExportHandler) DeleteExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "export", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "data export")
+	if !ok {
+		return
+	}
+
+	if err := h.exports.Delete(userID, id); err != nil {
+		respondWithDataExportError(w, err, "Failed to delete data export")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Data export deleted successfully",
+	})
+}
+
+// Download serves the file of an export for a signed link
+// (GET /api/v1/data-exports/download/{id}?expires=&signature=). It is public;
+// the signature authorizes the download, so links can be handed to tools.
+func (h *DataExportHandler) Download(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(w, r, 4, "data export")
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	export, err := h.exports.Download(id, query.Get("expires"), query.Get("signature"))
+	if err != nil {
+		respondWithDataExportError(w, err, "Failed to download data export")
+		return
+	}
+
+	contentType := "text/csv"
+	if export.Format == model.DataExportFormatParquet {
+		contentType = "application/vnd.apache.parquet"
+	}
+	filename := fmt.Sprintf("%s-%s.%s", export.Dataset, export.CreatedAt.Format("20060102-150405"), export.Format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(len(export.Data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(export.Data)
+}
+
+// respondWithDataExportError maps data export service errors to responses
+func respondWithDataExportError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidDataExport):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrDataExportNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Data export not found")
+	case errors.Is(err, service.ErrDataExportLinkInvalid):
+		respondWithError(w, http.StatusForbidden, "FORBIDDEN", err.Error())
+	case errors.Is(err, service.ErrDataExportNotReady):
+		respondWithError(w, http.StatusGone, "EXPORT_NOT_READY", "Data export has not been generated or has expired")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
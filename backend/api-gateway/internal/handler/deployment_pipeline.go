@@ -0,0 +1,276 @@
+// Package handler provides HTTP handlers for deployment pipelines, their runs
+// and the webhook CI triggers them through
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// maxPipelineRequestBytes caps the body CI posts to a pipeline's webhook
+const maxPipelineRequestBytes = 64 << 10
+
+// DeploymentPipelineHandler manages deployment pipelines and runs them
+type DeploymentPipelineHandler struct {
+	pipelines *service.DeploymentPipelineService
+}
+
+// NewDeploymentPipelineHandler creates a new deployment pipeline handler
+func NewDeploymentPipelineHandler(pipelines *service.DeploymentPipelineService) *DeploymentPipelineHandler {
+	return &DeploymentPipelineHandler{pipelines: pipelines}
+}
+
+// ListPipelines lists the pipelines the user may view, those of ?clusterId=
+// when it is set
+func (h *DeploymentPipelineHandler) ListPipelines(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var clusterID *uuid.UUID
+	if value := r.URL.Query().Get("clusterId"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid cluster ID")
+			return
+		}
+		clusterID = &id
+	}
+
+	pipelines, err := h.pipelines.Pipelines(userID, clusterID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list deployment pipelines")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  pipelines,
+		"total": len(pipelines),
+	})
+}
+
+// CreatePipeline adds a pipeline. The response carries its secret, which
+// cannot be read again.
+func (h *DeploymentPipelineHandler) CreatePipeline(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateDeploymentPipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if req.ClusterID == uuid.Nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "clusterId is required")
+		return
+	}
+
+	username, _ := r.Context().Value("username").(string)
+	pipeline, err := h.pipelines.Create(userID, username, &req)
+	if err != nil {
+		respondWithPipelineError(w, err, "Failed to create deployment pipeline")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"data": pipeline,
+	})
+}
+
+// GetPipeline gets a pipeline
+func (h *DeploymentPipelineHandler) GetPipeline(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "pipeline")
+	if !ok {
+		return
+	}
+
+	pipeline, err := h.pipelines.Pipeline(userID, id)
+	if err != nil {
+		respondWithPipelineError(w, err, "Failed to fetch deployment pipeline")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": pipeline,
+	})
+}
+
+// UpdatePipeline changes a pipeline
+func (h *DeploymentPipelineHandler) UpdatePipeline(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "pipeline")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateDeploymentPipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	pipeline, err := h.pipelines.Update(userID, id, &req)
+	if err != nil {
+		respondWithPipelineError(w, err, "Failed to update deployment pipeline")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": pipeline,
+	})
+}
+
+// DeletePipeline removes a pipeline and its runs
+func (h *DeploymentPipelineHandler) DeletePipeline(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "pipeline")
+	if !ok {
+		return
+	}
+
+	if err := h.pipelines.Delete(userID, id); err != nil {
+		respondWithPipelineError(w, err, "Failed to delete deployment pipeline")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Deployment pipeline deleted",
+	})
+}
+
+// RotateSecret replaces a pipeline's secret and returns the new one
+func (h *DeploymentPipelineHandler) RotateSecret(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "pipeline")
+	if !ok {
+		return
+	}
+
+	pipeline, err := h.pipelines.RotateSecret(userID, id)
+	if err != nil {
+		respondWithPipelineError(w, err, "Failed to rotate deployment pipeline secret")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": pipeline,
+	})
+}
+
+// TriggerPipeline rolls out a tag from the UI or API, for users allowed to
+// run the pipeline
+func (h *DeploymentPipelineHandler) TriggerPipeline(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "pipeline")
+	if !ok {
+		return
+	}
+
+	var req model.TriggerDeploymentPipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	username, _ := r.Context().Value("username").(string)
+	run, err := h.pipelines.Trigger(userID, username, id, &req)
+	if err != nil {
+		respondWithPipelineError(w, err, "Failed to start deployment pipeline run")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": run,
+	})
+}
+
+// ListRuns lists a pipeline's runs, newest first, up to ?limit=
+func (h *DeploymentPipelineHandler) ListRuns(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "pipeline")
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	runs, err := h.pipelines.Runs(userID, id, limit)
+	if err != nil {
+		respondWithPipelineError(w, err, "Failed to list deployment pipeline runs")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  runs,
+		"total": len(runs),
+	})
+}
+
+// Inbound rolls out the tag CI posted to a pipeline's webhook
+// (POST /api/v1/pipelines/inbound/{id}). It is public; the body is signed
+// with the pipeline's secret.
+func (h *DeploymentPipelineHandler) Inbound(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(w, r, 4, "pipeline")
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPipelineRequestBytes))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	run, err := h.pipelines.HandleInbound(id, r.Header, body)
+	if err != nil {
+		respondWithPipelineError(w, err, "Failed to start deployment pipeline run")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": run,
+	})
+}
+
+// respondWithPipelineError maps deployment pipeline service errors to responses
+func respondWithPipelineError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrPipelineNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Deployment pipeline not found")
+	case errors.Is(err, service.ErrClusterNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	case errors.Is(err, service.ErrHelmReleaseNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Helm release not found")
+	case errors.Is(err, service.ErrInvalidPipeline):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrPipelineForbidden):
+		respondWithError(w, http.StatusForbidden, "PERMISSION_DENIED", err.Error())
+	case errors.Is(err, service.ErrPipelineUnauthorized):
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid deployment pipeline signature")
+	case errors.Is(err, service.ErrPipelineDisabled):
+		respondWithError(w, http.StatusConflict, "PIPELINE_DISABLED", err.Error())
+	case errors.Is(err, service.ErrPipelineRunInProgress):
+		respondWithError(w, http.StatusConflict, "RUN_IN_PROGRESS", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
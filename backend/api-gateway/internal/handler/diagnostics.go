@@ -0,0 +1,47 @@
+// Package handler provides the admin diagnostics bundle endpoint
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/logging"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DiagnosticsHandler serves diagnostics bundles to administrators
+type DiagnosticsHandler struct {
+	db          *gorm.DB
+	diagnostics *service.DiagnosticsService
+	logger      *zap.Logger
+}
+
+// NewDiagnosticsHandler creates a new diagnostics handler
+func NewDiagnosticsHandler(db *gorm.DB, diagnostics *service.DiagnosticsService, logger *zap.Logger) *DiagnosticsHandler {
+	return &DiagnosticsHandler{db: db, diagnostics: diagnostics, logger: logger}
+}
+
+// CreateBundle handles POST /api/v1/admin/diagnostics, a sanitized tar.gz of
+// the gateway's version, configuration, recent errors, schema, job queue,
+// inventory, health and route latency for support
+func (h *DiagnosticsHandler) CreateBundle(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "system", "diagnostics", nil, "") {
+		return
+	}
+
+	bundle := h.diagnostics.Collect(r.Context(), userID, logging.RequestID(r.Context()))
+	filename := fmt.Sprintf("myops-diagnostics-%s.tar.gz", bundle.Manifest.CreatedAt.Format("20060102T150405Z"))
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	if err := bundle.Write(w); err != nil {
+		h.logger.Warn("failed to write diagnostics bundle", zap.Error(err))
+	}
+}
@@ -0,0 +1,78 @@
+// Package handler provides HTTP handlers for directory sync
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// DirectorySyncHandler handles directory sync operations
+type DirectorySyncHandler struct {
+	db       *gorm.DB
+	sync     *service.DirectorySyncService
+	settings *service.SettingsService
+}
+
+// NewDirectorySyncHandler creates a new directory sync handler
+func NewDirectorySyncHandler(db *gorm.DB, sync *service.DirectorySyncService, settings *service.SettingsService) *DirectorySyncHandler {
+	return &DirectorySyncHandler{db: db, sync: sync, settings: settings}
+}
+
+// GetStatus returns the schedule and the report of the last applied sync
+func (h *DirectorySyncHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "users", "list", nil, "") {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":    h.settings.Bool(model.SettingDirectorySyncEnabled),
+		"interval":   h.settings.String(model.SettingDirectorySyncInterval),
+		"scim":       h.settings.Bool(model.SettingSCIMEnabled),
+		"lastReport": h.sync.LastReport(),
+	})
+}
+
+// Preview runs a dry-run sync and returns the changes it would make
+func (h *DirectorySyncHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	h.run(w, r, true)
+}
+
+// Apply runs a sync now
+func (h *DirectorySyncHandler) Apply(w http.ResponseWriter, r *http.Request) {
+	h.run(w, r, false)
+}
+
+func (h *DirectorySyncHandler) run(w http.ResponseWriter, r *http.Request, dryRun bool) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "users", "manage", nil, "") {
+		return
+	}
+
+	report, err := h.sync.SyncLDAP(r.Context(), dryRun)
+	switch {
+	case errors.Is(err, service.ErrDirectoryNotConfigured):
+		respondWithError(w, http.StatusServiceUnavailable, "LDAP_NOT_CONFIGURED", "LDAP is not configured")
+	case errors.Is(err, service.ErrDirectorySyncRunning):
+		respondWithError(w, http.StatusConflict, "SYNC_RUNNING", "A directory sync is already running")
+	case report == nil:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to sync directory")
+	default:
+		// A failed sync still reports what it did before failing
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusBadGateway
+		}
+		respondWithJSON(w, status, report)
+	}
+}
@@ -0,0 +1,197 @@
+// Package handler provides the websocket stream of platform events
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// Event stream settings
+const (
+	eventStreamBuffer       = 256
+	eventStreamWriteTimeout = 10 * time.Second
+)
+
+// EventStreamMessage is a message sent to or received from an event stream client.
+// Clients send "subscribe" messages; the server sends "subscribed", "event",
+// "dropped" and "error" messages.
+type EventStreamMessage struct {
+	Type    string               `json:"type"`
+	Types   []model.EventType    `json:"types,omitempty"`
+	Filters map[string][]string  `json:"filters,omitempty"`
+	Denied  []model.EventType    `json:"denied,omitempty"` // Requested types the user may not stream
+	Event   *model.PlatformEvent `json:"event,omitempty"`
+	Count   int                  `json:"count,omitempty"` // Events dropped because the client fell behind
+	Message string               `json:"message,omitempty"`
+}
+
+// eventStreamSubscription is the set of events a client currently wants
+type eventStreamSubscription struct {
+	types   map[model.EventType]bool
+	filters map[string][]string
+}
+
+func (s *eventStreamSubscription) matches(event *model.PlatformEvent) bool {
+	return s.types[event.Type] && service.MatchEventFilters(s.filters, event.Attributes)
+}
+
+// EventStreamHandler streams the user's platform events over a websocket
+type EventStreamHandler struct {
+	db  *gorm.DB
+	bus *service.EventBus
+}
+
+// NewEventStreamHandler creates a new event stream handler
+func NewEventStreamHandler(db *gorm.DB, bus *service.EventBus) *EventStreamHandler {
+	return &EventStreamHandler{db: db, bus: bus}
+}
+
+// ServeHTTP upgrades the connection and streams events. The initial subscription is
+// taken from the types (comma separated) and filter (attr:value, repeatable) query
+// parameters and can be replaced at any time with a subscribe message.
+func (h *EventStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, userID, ok := authenticateWebSocket(w, r)
+	if !ok {
+		return
+	}
+
+	initial := EventStreamMessage{Type: "subscribe", Filters: map[string][]string{}}
+	for _, t := range strings.Split(r.URL.Query().Get("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			initial.Types = append(initial.Types, model.EventType(t))
+		}
+	}
+	for _, f := range r.URL.Query()["filter"] {
+		attr, value, found := strings.Cut(f, ":")
+		if !found || attr == "" {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "filter must be attribute:value")
+			return
+		}
+		initial.Filters[attr] = append(initial.Filters[attr], value)
+	}
+
+	conn, err := upgradeWebSocket(w, r, userID)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Subscribe before reading so no event published from here on is missed
+	sub := h.bus.Subscribe(userID, eventStreamBuffer)
+	defer sub.Close()
+
+	// The reader forwards subscription changes to the writer, which owns the connection
+	requests := make(chan EventStreamMessage, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var msg EventStreamMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			select {
+			case requests <- msg:
+			case <-time.After(eventStreamWriteTimeout):
+			}
+		}
+	}()
+
+	current := &eventStreamSubscription{types: map[model.EventType]bool{}}
+	if !h.subscribe(conn, userID, current, initial) {
+		return
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case msg := <-requests:
+			if msg.Type != "subscribe" {
+				if !writeEventStreamMessage(conn, EventStreamMessage{Type: "error", Message: "unknown message type " + msg.Type}) {
+					return
+				}
+				continue
+			}
+			if !h.subscribe(conn, userID, current, msg) {
+				return
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if n := sub.Dropped(); n > 0 {
+				if !writeEventStreamMessage(conn, EventStreamMessage{Type: "dropped", Count: n}) {
+					return
+				}
+			}
+			if !current.matches(event) {
+				continue
+			}
+			if !writeEventStreamMessage(conn, EventStreamMessage{Type: "event", Event: event}) {
+				return
+			}
+		}
+	}
+}
+
+// subscribe replaces the client's subscription with the requested types the user is
+// permitted to stream and acknowledges it. An empty type list or "*" means every event.
+func (h *EventStreamHandler) subscribe(conn *wsConn, userID uuid.UUID, current *eventStreamSubscription, req EventStreamMessage) bool {
+	requested := req.Types
+	if len(requested) == 0 || containsEventType(requested, model.EventAll) {
+		requested = nil
+		for _, info := range model.EventCatalog {
+			if info.Type != model.EventWebhookPing {
+				requested = append(requested, info.Type)
+			}
+		}
+	}
+
+	ack := EventStreamMessage{Type: "subscribed", Types: []model.EventType{}, Filters: req.Filters}
+	types := make(map[model.EventType]bool, len(requested))
+	for _, t := range requested {
+		info, ok := model.LookupEvent(t)
+		if !ok || t == model.EventWebhookPing {
+			return writeEventStreamMessage(conn, EventStreamMessage{Type: "error", Message: "unknown event type " + string(t)})
+		}
+		if info.Permission != "" {
+			resource, action, _ := strings.Cut(info.Permission, ".")
+			if !model.UserHasPermission(h.db, userID, resource, action, nil, "").Allowed {
+				ack.Denied = append(ack.Denied, t)
+				continue
+			}
+		}
+		types[t] = true
+		ack.Types = append(ack.Types, t)
+	}
+
+	current.types = types
+	current.filters = req.Filters
+	return writeEventStreamMessage(conn, ack)
+}
+
+func writeEventStreamMessage(conn *wsConn, msg EventStreamMessage) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return true
+	}
+	return conn.WriteMessage(websocket.TextMessage, data) == nil
+}
+
+func containsEventType(types []model.EventType, t model.EventType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+// Package handler provides HTTP handlers for cross-signal exploration
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// correlationTimeout bounds a correlation call across all backends
+const correlationTimeout = 45 * time.Second
+
+// ExploreHandler handles correlated queries across metrics, logs and traces
+type ExploreHandler struct {
+	db          *gorm.DB
+	correlation *service.CorrelationService
+}
+
+// NewExploreHandler creates a new explore handler
+func NewExploreHandler(db *gorm.DB) *ExploreHandler {
+	return &ExploreHandler{db: db, correlation: service.NewCorrelationService(db)}
+}
+
+// Correlate returns the metrics, logs and traces of a pod, host or service over a time
+// range, aligned to a common step
+func (h *ExploreHandler) Correlate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CorrelationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), correlationTimeout)
+	defer cancel()
+
+	result, err := h.correlation.Correlate(ctx, userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCorrelation):
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		case errors.Is(err, service.ErrCorrelationResourceNotFound):
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+		default:
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to correlate signals")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": result,
+	})
+}
@@ -0,0 +1,122 @@
+// Package handler provides HTTP handlers for feature flags
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// FeatureFlagHandler handles feature flag operations
+type FeatureFlagHandler struct {
+	db    *gorm.DB
+	flags *service.FeatureFlagService
+}
+
+// NewFeatureFlagHandler creates a new feature flag handler
+func NewFeatureFlagHandler(db *gorm.DB, flags *service.FeatureFlagService) *FeatureFlagHandler {
+	return &FeatureFlagHandler{db: db, flags: flags}
+}
+
+// ListFlags lists the built-in and custom flags with their targeting
+func (h *FeatureFlagHandler) ListFlags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "feature_flags", "view", nil, "") {
+		return
+	}
+
+	flags := h.flags.List()
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  flags,
+		"total": len(flags),
+	})
+}
+
+// GetFlag gets one flag
+func (h *FeatureFlagHandler) GetFlag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "feature_flags", "view", nil, "") {
+		return
+	}
+
+	flag, err := h.flags.Get(featureFlagKey(r))
+	if err != nil {
+		respondWithFeatureFlagError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, flag)
+}
+
+// UpdateFlag sets a flag's state and targeting, creating custom flags as needed.
+// The change applies without a restart.
+func (h *FeatureFlagHandler) UpdateFlag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "feature_flags", "manage", nil, "") {
+		return
+	}
+
+	var req model.UpdateFeatureFlagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	flag, err := h.flags.Set(featureFlagKey(r), &req, userID)
+	if err != nil {
+		respondWithFeatureFlagError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, flag)
+}
+
+// DeleteFlag returns a built-in flag to its default or removes a custom flag
+func (h *FeatureFlagHandler) DeleteFlag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "feature_flags", "manage", nil, "") {
+		return
+	}
+
+	if err := h.flags.Delete(featureFlagKey(r), userID); err != nil {
+		respondWithFeatureFlagError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Feature flag reset successfully",
+	})
+}
+
+// featureFlagKey returns the flag key in /api/v1/feature-flags/{key}
+func featureFlagKey(r *http.Request) string {
+	parts := splitPath(r.URL.Path)
+	if len(parts) < 4 {
+		return ""
+	}
+	return parts[3]
+}
+
+func respondWithFeatureFlagError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Feature flag not found")
+	case errors.Is(err, service.ErrInvalidFeatureFlag):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update feature flag")
+	}
+}
@@ -2,6 +2,8 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -132,19 +134,37 @@ func (h *FileTransferHandler) ListDirectory(w http.ResponseWriter, r *http.Reque
 
 // UploadFile handles file upload requests
 func (h *FileTransferHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
-	// Parse multipart form
-	if err := r.ParseMultipartForm(32 << 20); err != nil { // 32MB max
-		respondWithError(w, http.StatusBadRequest, "INVALID_FORM", "Failed to parse form")
+	// Stream the uploaded file to a temporary file, hashing it on the way
+	var tempPath string
+	var fileSize int64
+	hash := sha256.New()
+	defer func() {
+		if tempPath != "" {
+			os.Remove(tempPath)
+		}
+	}()
+	upload, err := readMultipartUpload(r, "file", func(_ string, file io.Reader) error {
+		tempFile, err := os.CreateTemp("", "upload-*.tmp")
+		if err != nil {
+			return err
+		}
+		defer tempFile.Close()
+		tempPath = tempFile.Name()
+		fileSize, err = io.Copy(io.MultiWriter(tempFile, hash), file)
+		return err
+	})
+	if err != nil {
+		respondUploadError(w, err, "FILE_READ_ERROR")
 		return
 	}
 
 	// Get form values
-	hostIDStr := r.FormValue("hostId")
-	remotePath := r.FormValue("remotePath")
-	username := r.FormValue("username")
-	password := r.FormValue("password")
-	key := r.FormValue("key")
-	overwriteStr := r.FormValue("overwrite")
+	hostIDStr := upload.Fields["hostId"]
+	remotePath := upload.Fields["remotePath"]
+	username := upload.Fields["username"]
+	password := upload.Fields["password"]
+	key := upload.Fields["key"]
+	overwriteStr := upload.Fields["overwrite"]
 
 	if hostIDStr == "" || remotePath == "" {
 		respondWithError(w, http.StatusBadRequest, "MISSING_FIELDS", "hostId and remotePath are required")
@@ -189,14 +209,6 @@ func (h *FileTransferHandler) UploadFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get uploaded file
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "NO_FILE", "No file uploaded")
-		return
-	}
-	defer file.Close()
-
 	// Create file transfer record
 	transferID := uuid.New()
 	transfer := &model.FileTransfer{
@@ -204,10 +216,10 @@ func (h *FileTransferHandler) UploadFile(w http.ResponseWriter, r *http.Request)
 		HostID:      hostID,
 		UserID:      userID,
 		Direction:   model.FileTransferDirectionUpload,
-		SourcePath:  header.Filename,
+		SourcePath:  upload.FileName,
 		TargetPath:  remotePath,
-		FileName:    header.Filename,
-		FileSize:    header.Size,
+		FileName:    upload.FileName,
+		FileSize:    fileSize,
 		Status:      model.FileTransferStatusRunning,
 		StartedAt:   timePtr(time.Now()),
 	}
@@ -228,9 +240,17 @@ func (h *FileTransferHandler) UploadFile(w http.ResponseWriter, r *http.Request)
 		Timeout:    30 * time.Second,
 	}
 
+	uploadDetails := map[string]interface{}{
+		"transferId": transferID,
+		"fileName":   upload.FileName,
+		"targetPath": filepath.Join(remotePath, upload.FileName),
+		"size":       fileSize,
+	}
+
 	client, err := ssh.NewSFTPClient(config)
 	if err != nil {
 		h.updateTransferStatus(transferID, model.FileTransferStatusFailed, err.Error())
+		auditFileTransfer(h.db, r, userID, "file_upload", &host, uploadDetails, http.StatusInternalServerError, err)
 		respondWithError(w, http.StatusInternalServerError, "CONNECTION_FAILED", fmt.Sprintf("Failed to connect: %v", err))
 		return
 	}
@@ -244,32 +264,17 @@ func (h *FileTransferHandler) UploadFile(w http.ResponseWriter, r *http.Request)
 		}
 	}()
 
-	// Create temporary file for the upload
-	tempFile, err := os.CreateTemp("", "upload-*.tmp")
-	if err != nil {
-		h.updateTransferStatus(transferID, model.FileTransferStatusFailed, err.Error())
-		respondWithError(w, http.StatusInternalServerError, "TEMP_FILE_ERROR", "Failed to create temp file")
-		return
-	}
-	tempPath := tempFile.Name()
-	defer os.Remove(tempPath)
-
-	// Copy uploaded content to temp file
-	_, err = io.Copy(tempFile, file)
-	tempFile.Close()
-	if err != nil {
-		h.updateTransferStatus(transferID, model.FileTransferStatusFailed, err.Error())
-		respondWithError(w, http.StatusInternalServerError, "FILE_READ_ERROR", "Failed to read uploaded file")
-		return
-	}
-
 	// Upload via SFTP
-	targetPath := filepath.Join(remotePath, header.Filename)
+	targetPath := filepath.Join(remotePath, upload.FileName)
 	transferred, err := client.UploadFile(tempPath, targetPath, progress)
 	close(progress)
 
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	uploadDetails["checksum"] = checksum
+
 	if err != nil {
 		h.updateTransferStatus(transferID, model.FileTransferStatusFailed, err.Error())
+		auditFileTransfer(h.db, r, userID, "file_upload", &host, uploadDetails, http.StatusInternalServerError, err)
 		respondWithError(w, http.StatusInternalServerError, "UPLOAD_FAILED", fmt.Sprintf("Failed to upload: %v", err))
 		return
 	}
@@ -279,15 +284,19 @@ func (h *FileTransferHandler) UploadFile(w http.ResponseWriter, r *http.Request)
 	h.db.Model(&model.FileTransfer{}).Where("id = ?", transferID).Updates(map[string]interface{}{
 		"status":      model.FileTransferStatusCompleted,
 		"transferred": transferred,
+		"checksum":    checksum,
 		"completed_at": &now,
 	})
+	uploadDetails["size"] = transferred
+	auditFileTransfer(h.db, r, userID, "file_upload", &host, uploadDetails, http.StatusOK, nil)
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"data": map[string]interface{}{
 			"transferId": transferID,
-			"fileName":   header.Filename,
+			"fileName":   upload.FileName,
 			"size":       transferred,
 			"targetPath": targetPath,
+			"checksum":   checksum,
 		},
 	})
 }
@@ -341,8 +350,13 @@ func (h *FileTransferHandler) DownloadFile(w http.ResponseWriter, r *http.Reques
 		Timeout:    30 * time.Second,
 	}
 
+	downloadDetails := map[string]interface{}{
+		"sourcePath": req.RemotePath,
+	}
+
 	client, err := ssh.NewSFTPClient(config)
 	if err != nil {
+		auditFileTransfer(h.db, r, userID, "file_download", &host, downloadDetails, http.StatusInternalServerError, err)
 		respondWithError(w, http.StatusInternalServerError, "CONNECTION_FAILED", fmt.Sprintf("Failed to connect: %v", err))
 		return
 	}
@@ -397,8 +411,12 @@ func (h *FileTransferHandler) DownloadFile(w http.ResponseWriter, r *http.Reques
 	transferred, err := client.DownloadFile(req.RemotePath, tempPath, progress)
 	close(progress)
 
+	downloadDetails["transferId"] = transferID
+	downloadDetails["fileName"] = fileInfo.Name
+
 	if err != nil {
 		h.updateTransferStatus(transferID, model.FileTransferStatusFailed, err.Error())
+		auditFileTransfer(h.db, r, userID, "file_download", &host, downloadDetails, http.StatusInternalServerError, err)
 		respondWithError(w, http.StatusInternalServerError, "DOWNLOAD_FAILED", fmt.Sprintf("Failed to download: %v", err))
 		return
 	}
@@ -411,13 +429,20 @@ func (h *FileTransferHandler) DownloadFile(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	sum := sha256.Sum256(downloadedFile)
+	checksum := hex.EncodeToString(sum[:])
+
 	// Update transfer record as completed
 	now := time.Now()
 	h.db.Model(&model.FileTransfer{}).Where("id = ?", transferID).Updates(map[string]interface{}{
 		"status":       model.FileTransferStatusCompleted,
 		"transferred":  transferred,
+		"checksum":     checksum,
 		"completed_at": &now,
 	})
+	downloadDetails["size"] = transferred
+	downloadDetails["checksum"] = checksum
+	auditFileTransfer(h.db, r, userID, "file_download", &host, downloadDetails, http.StatusOK, nil)
 
 	// Set response headers
 	w.Header().Set("Content-Type", "application/octet-stream")
@@ -476,19 +501,32 @@ func (h *FileTransferHandler) DeleteFile(w http.ResponseWriter, r *http.Request)
 		Timeout:    30 * time.Second,
 	}
 
+	deleteDetails := map[string]interface{}{
+		"path": req.RemotePath,
+	}
+
 	client, err := ssh.NewSFTPClient(config)
 	if err != nil {
+		auditFileTransfer(h.db, r, userID, "file_delete", &host, deleteDetails, http.StatusInternalServerError, err)
 		respondWithError(w, http.StatusInternalServerError, "CONNECTION_FAILED", fmt.Sprintf("Failed to connect: %v", err))
 		return
 	}
 	defer client.Close()
 
+	// Record what was deleted; the checksum is left out when it cannot be read
+	if checksum, err := client.Checksum(req.RemotePath); err == nil {
+		deleteDetails["checksum"] = checksum
+	}
+
 	// Delete file
 	if err := client.DeleteFile(req.RemotePath); err != nil {
+		auditFileTransfer(h.db, r, userID, "file_delete", &host, deleteDetails, http.StatusInternalServerError, err)
 		respondWithError(w, http.StatusInternalServerError, "DELETE_FAILED", fmt.Sprintf("Failed to delete file: %v", err))
 		return
 	}
 
+	auditFileTransfer(h.db, r, userID, "file_delete", &host, deleteDetails, http.StatusOK, nil)
+
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "File deleted successfully",
 		"path":    req.RemotePath,
@@ -0,0 +1,247 @@
+// Package handler provides HTTP handlers for file distribution
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/ssh"
+	"gorm.io/gorm"
+)
+
+// CreateFileDistribution handles requests to distribute one file to many hosts.
+// The request is either JSON with a sourceUrl, or multipart with a "spec" JSON
+// field and the uploaded "file".
+func (h *BatchTaskHandler) CreateFileDistribution(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	var userID uuid.UUID
+	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
+		if uid, ok := userIDVal.(string); ok {
+			userID, _ = uuid.Parse(uid)
+		}
+	}
+
+	if userID == (uuid.UUID{}) {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return
+	}
+
+	// The staged file is removed unless the distribution is created
+	distributionID := uuid.New()
+	var staged *service.StagedFile
+	created := false
+	defer func() {
+		if staged != nil && !created {
+			os.Remove(staged.Path)
+		}
+	}()
+
+	var req model.CreateFileDistributionRequest
+	isUpload := strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data")
+	if isUpload {
+		// Stage the uploaded file as it streams in
+		upload, err := readMultipartUpload(r, "file", func(fileName string, file io.Reader) error {
+			var err error
+			staged, err = service.StageDistributionFile(distributionID, fileName, file)
+			return err
+		})
+		if errors.Is(err, service.ErrFileTooLarge) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "FILE_TOO_LARGE", err.Error())
+			return
+		}
+		if err != nil {
+			respondUploadError(w, err, "STAGING_FAILED")
+			return
+		}
+		if err := json.Unmarshal([]byte(upload.Fields["spec"]), &req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid distribution spec")
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	// Validate request
+	if req.Name == "" || req.TargetPath == "" {
+		respondWithError(w, http.StatusBadRequest, "MISSING_FIELDS", "name and targetPath are required")
+		return
+	}
+	if _, err := ssh.ValidatePath(req.TargetPath); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", err.Error())
+		return
+	}
+	if !isUpload && req.SourceURL == "" {
+		respondWithError(w, http.StatusBadRequest, "NO_SOURCE", "Either upload a file or provide sourceUrl")
+		return
+	}
+
+	hosts, err := service.ResolveHostSelector(h.db, req.Selector)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_SELECTOR", err.Error())
+		return
+	}
+	if len(hosts) == 0 {
+		respondWithError(w, http.StatusBadRequest, "NO_HOSTS", "No available hosts match the selector")
+		return
+	}
+
+	// Stage the source file once for all hosts
+	sourceType := model.FileDistributionSourceUpload
+	if !isUpload {
+		sourceType = model.FileDistributionSourceURL
+		staged, err = service.FetchDistributionFile(r.Context(), distributionID, req.SourceURL)
+		if errors.Is(err, service.ErrSourceAddressNotAllowed) {
+			respondWithError(w, http.StatusBadRequest, "INVALID_SOURCE_URL", err.Error())
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusBadGateway, "FETCH_FAILED", err.Error())
+			return
+		}
+	}
+	if !enforceQuota(w, userID, model.QuotaResourceStagedBytes, staged.Size) {
+		return
+	}
+
+	fileName := staged.FileName
+	if req.FileName != "" {
+		fileName = req.FileName
+	}
+
+	// Targets ending in "/" are directories; the file keeps its name
+	targetPath := req.TargetPath
+	if strings.HasSuffix(targetPath, "/") {
+		targetPath += fileName
+	}
+
+	// Set default values
+	if req.Strategy == "" {
+		req.Strategy = model.StrategyParallel
+	}
+	if req.Timeout <= 0 {
+		req.Timeout = 300
+	}
+	verify := true
+	if req.Verify != nil {
+		verify = *req.Verify
+	}
+
+	task := &model.BatchTask{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Name:        req.Name,
+		Description: req.Description,
+		Type:        model.BatchTaskTypeFileDistribution,
+		Status:      model.BatchTaskStatusPending,
+		Strategy:    req.Strategy,
+		Command:     fmt.Sprintf("distribute %s -> %s", fileName, targetPath),
+		Timeout:     req.Timeout,
+		Parallelism: req.Parallelism,
+		TotalHosts:  int32(len(hosts)),
+	}
+
+	distribution := &model.FileDistribution{
+		ID:          distributionID,
+		BatchTaskID: task.ID,
+		SourceType:  sourceType,
+		SourceURL:   req.SourceURL,
+		FileName:    fileName,
+		FileSize:    staged.Size,
+		Checksum:    staged.Checksum,
+		StagedPath:  staged.Path,
+		TargetPath:  targetPath,
+		Mode:        req.Mode,
+		Owner:       req.Owner,
+		Group:       req.Group,
+		Verify:      verify,
+	}
+
+	// Create the task, the distribution and the host records together
+	hostIDs := make([]uuid.UUID, len(hosts))
+	taskHosts := make([]model.BatchTaskHost, len(hosts))
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(task).Error; err != nil {
+			return err
+		}
+		distribution.BatchTaskID = task.ID
+		if err := tx.Create(distribution).Error; err != nil {
+			return err
+		}
+		for i, host := range hosts {
+			hostIDs[i] = host.ID
+			taskHosts[i] = model.BatchTaskHost{
+				BatchTaskID: task.ID,
+				HostID:      host.ID,
+				Status:      model.BatchTaskStatusPending,
+			}
+		}
+		return tx.Create(&taskHosts).Error
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create distribution")
+		return
+	}
+	created = true
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"data": map[string]interface{}{
+			"task":         task,
+			"distribution": distribution,
+			"hostIds":      hostIDs,
+		},
+	})
+}
+
+// GetFileDistribution returns a distribution with per-host progress and checksum verification
+func (h *BatchTaskHandler) GetFileDistribution(w http.ResponseWriter, r *http.Request) {
+	// Get task ID from URL path (/api/v1/batch-tasks/{id}/distribution)
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) < 5 || pathParts[2] != "batch-tasks" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+
+	taskID, err := uuid.Parse(pathParts[3])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_TASK_ID", "Invalid task ID")
+		return
+	}
+
+	// Get user ID from context
+	var userID uuid.UUID
+	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
+		if uid, ok := userIDVal.(string); ok {
+			userID, _ = uuid.Parse(uid)
+		}
+	}
+
+	if userID == (uuid.UUID{}) {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return
+	}
+
+	response, err := h.taskExecutor.GetDistribution(taskID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Distribution not found")
+		return
+	}
+
+	// Verify ownership
+	if response.BatchTask.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "FORBIDDEN", "Access denied")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": response,
+	})
+}
@@ -0,0 +1,252 @@
+// Package handler provides HTTP handlers for GitOps sources and their syncs
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// GitOpsHandler manages the Git sources applied to clusters and syncs them
+type GitOpsHandler struct {
+	gitops *service.GitOpsService
+}
+
+// NewGitOpsHandler creates a new GitOps handler
+func NewGitOpsHandler(gitops *service.GitOpsService) *GitOpsHandler {
+	return &GitOpsHandler{gitops: gitops}
+}
+
+// ListSources lists the user's sources, those of ?clusterId= when it is set
+func (h *GitOpsHandler) ListSources(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var clusterID *uuid.UUID
+	if value := r.URL.Query().Get("clusterId"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid cluster ID")
+			return
+		}
+		clusterID = &id
+	}
+
+	sources, err := h.gitops.Sources(userID, clusterID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list GitOps sources")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  sources,
+		"total": len(sources),
+	})
+}
+
+// CreateSource adds a source
+func (h *GitOpsHandler) CreateSource(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateGitOpsSourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if req.ClusterID == uuid.Nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "clusterId is required")
+		return
+	}
+
+	username, _ := r.Context().Value("username").(string)
+	source, err := h.gitops.Create(userID, username, &req)
+	if err != nil {
+		respondWithGitOpsError(w, err, "Failed to create GitOps source")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"data": source,
+	})
+}
+
+// GetSource gets a source with the objects it manages
+func (h *GitOpsHandler) GetSource(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "source")
+	if !ok {
+		return
+	}
+
+	source, err := h.gitops.Source(userID, id)
+	if err != nil {
+		respondWithGitOpsError(w, err, "Failed to fetch GitOps source")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": source,
+	})
+}
+
+// UpdateSource changes a source
+func (h *GitOpsHandler) UpdateSource(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "source")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateGitOpsSourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	source, err := h.gitops.Update(userID, id, &req)
+	if err != nil {
+		respondWithGitOpsError(w, err, "Failed to update GitOps source")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": source,
+	})
+}
+
+// DeleteSource removes a source; with ?prune=true the objects it manages are
+// deleted from the cluster too
+func (h *GitOpsHandler) DeleteSource(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "source")
+	if !ok {
+		return
+	}
+
+	prune := r.URL.Query().Get("prune") == "true"
+	if err := h.gitops.Delete(r.Context(), userID, id, prune); err != nil {
+		respondWithGitOpsError(w, err, "Failed to delete GitOps source")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "GitOps source deleted",
+	})
+}
+
+// SyncSource starts a sync of a source
+func (h *GitOpsHandler) SyncSource(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "source")
+	if !ok {
+		return
+	}
+
+	var req model.SyncGitOpsSourceRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+			return
+		}
+	}
+
+	username, _ := r.Context().Value("username").(string)
+	sync, err := h.gitops.Sync(userID, username, id, &req)
+	if err != nil {
+		respondWithGitOpsError(w, err, "Failed to start GitOps sync")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": sync,
+	})
+}
+
+// RollbackSource re-applies the commit of an earlier successful sync
+func (h *GitOpsHandler) RollbackSource(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "source")
+	if !ok {
+		return
+	}
+
+	var req model.RollbackGitOpsSourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if req.SyncID == uuid.Nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "syncId is required")
+		return
+	}
+
+	username, _ := r.Context().Value("username").(string)
+	sync, err := h.gitops.Rollback(userID, username, id, &req)
+	if err != nil {
+		respondWithGitOpsError(w, err, "Failed to roll back GitOps source")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": sync,
+	})
+}
+
+// ListSyncs lists a source's syncs, newest first, up to ?limit=
+func (h *GitOpsHandler) ListSyncs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "source")
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	syncs, err := h.gitops.Syncs(userID, id, limit)
+	if err != nil {
+		respondWithGitOpsError(w, err, "Failed to list GitOps syncs")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  syncs,
+		"total": len(syncs),
+	})
+}
+
+// respondWithGitOpsError sends the status of a GitOps error
+func respondWithGitOpsError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrGitOpsSourceNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "GitOps source not found")
+	case errors.Is(err, service.ErrGitOpsSyncNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "GitOps sync not found")
+	case errors.Is(err, service.ErrClusterNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	case errors.Is(err, service.ErrInvalidGitOpsSource):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrGitOpsSyncInProgress):
+		respondWithError(w, http.StatusConflict, "SYNC_IN_PROGRESS", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
@@ -2,6 +2,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strconv"
@@ -9,18 +10,34 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/db"
 	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
 	"gorm.io/gorm"
 )
 
 // GrafanaHandler handles Grafana integration operations
 type GrafanaHandler struct {
-	db *gorm.DB
+	db         *gorm.DB
+	events     *service.EventBus
+	importer   *service.GrafanaImportService
+	operations *service.OperationService
 }
 
 // NewGrafanaHandler creates a new Grafana handler
 func NewGrafanaHandler(db *gorm.DB) *GrafanaHandler {
-	return &GrafanaHandler{db: db}
+	return &GrafanaHandler{db: db, importer: service.NewGrafanaImportService(db)}
+}
+
+// SetEventBus sets the bus sync completion events are published on
+func (h *GrafanaHandler) SetEventBus(events *service.EventBus) {
+	h.events = events
+}
+
+// SetOperations sets the service instance syncs run as operations of
+func (h *GrafanaHandler) SetOperations(operations *service.OperationService) {
+	h.operations = operations
 }
 
 // ============== Instance Management ==============
@@ -382,13 +399,10 @@ func (h *GrafanaHandler) DeleteInstance(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Delete associated dashboards, data sources, and folders
-	h.db.Where("instance_id = ?", instanceUUID).Delete(&model.GrafanaDashboard{})
-	h.db.Where("instance_id = ?", instanceUUID).Delete(&model.GrafanaDataSource{})
-	h.db.Where("instance_id = ?", instanceUUID).Delete(&model.GrafanaFolder{})
-
-	// Delete instance
-	if err := h.db.Delete(&instance).Error; err != nil {
+	// Delete the instance with its dashboards, data sources and folders
+	err = db.DeleteWithChildren(h.db, &instance, "instance_id", instanceUUID,
+		&model.GrafanaDashboard{}, &model.GrafanaDataSource{}, &model.GrafanaFolder{})
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete Grafana instance")
 		return
 	}
@@ -483,6 +497,25 @@ func (h *GrafanaHandler) SyncInstance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.db.Model(&instance).Update("sync_status", model.SyncStatusRunning)
+	operation, err := h.operations.Start(userUUID, service.OperationSpec{
+		Type:         model.OperationGrafanaSync,
+		ResourceType: "grafana_instance",
+		ResourceID:   &instance.ID,
+		Message:      "Syncing " + instance.Name,
+	}, func(ctx context.Context) (interface{}, error) {
+		return h.syncInstance(userUUID, instance, req), nil
+	})
+	if err != nil {
+		h.db.Model(&instance).Update("sync_status", model.SyncStatusFailed)
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to start Grafana sync")
+		return
+	}
+	respondAccepted(w, operation)
+}
+
+// syncInstance runs the sync of an instance, as an operation started by SyncInstance
+func (h *GrafanaHandler) syncInstance(userUUID uuid.UUID, instance model.GrafanaInstance, req model.SyncGrafanaInstanceRequest) model.SyncGrafanaInstanceResponse {
 	startTime := time.Now()
 
 	// TODO: Implement actual Grafana sync
@@ -513,7 +546,12 @@ func (h *GrafanaHandler) SyncInstance(w http.ResponseWriter, r *http.Request) {
 		Duration:         duration,
 	}
 
-	respondWithJSON(w, http.StatusOK, response)
+	h.events.Publish(userUUID, model.EventSyncFinished, map[string]string{
+		"source":   "grafana",
+		"sourceId": instance.ID.String(),
+	}, response)
+
+	return response
 }
 
 // ============== Dashboard Management ==============
@@ -570,10 +608,16 @@ func (h *GrafanaHandler) ListDashboards(w http.ResponseWriter, r *http.Request)
 		}
 	}
 	if tag := r.URL.Query().Get("tag"); tag != "" {
-		query = query.Where("tags LIKE ?", "%"+tag+"%")
+		query = query.Where("tags LIKE ?", sanitize.Contains(tag))
 	}
 	if search := r.URL.Query().Get("search"); search != "" {
-		query = query.Where("title LIKE ?", "%"+search+"%")
+		query = query.Where("title LIKE ?", sanitize.Contains(search))
+	}
+	// Platform tags, unlike the Grafana tags matched by tag
+	query, err = db.WithTags(query, model.TagResourceDashboard, r.URL.Query().Get("tags"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_SELECTOR", err.Error())
+		return
 	}
 
 	// Count total
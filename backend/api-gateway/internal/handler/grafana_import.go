@@ -0,0 +1,49 @@
+// Package handler provides HTTP handlers for importing Grafana dashboards
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// ImportDashboard converts a synced Grafana dashboard into a Prometheus dashboard.
+// It serves POST /api/v1/grafana/dashboards/{id}/import and reports the panels
+// that could not be converted; with dryRun nothing is saved.
+func (h *GrafanaHandler) ImportDashboard(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	dashboardID, ok := pathUUID(w, r, 4, "dashboard")
+	if !ok {
+		return
+	}
+
+	var req model.ConvertGrafanaDashboardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if !req.DryRun && !enforceQuota(w, userID, model.QuotaResourceDashboards, 1) {
+		return
+	}
+
+	result, err := h.importer.Import(userID, dashboardID, &req)
+	switch {
+	case errors.Is(err, service.ErrGrafanaDashboardNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Dashboard not found")
+	case errors.Is(err, service.ErrInvalidGrafanaImport):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to import dashboard")
+	case result.Dashboard == nil:
+		respondWithJSON(w, http.StatusOK, result)
+	default:
+		respondWithJSON(w, http.StatusCreated, result)
+	}
+}
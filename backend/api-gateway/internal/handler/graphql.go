@@ -0,0 +1,181 @@
+// Package handler provides the GraphQL read gateway
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxGraphQLQueryLength limits the size of a query document
+	maxGraphQLQueryLength = 16 << 10
+	// maxGraphQLDepth limits how deeply a query may nest fields
+	maxGraphQLDepth = 8
+	// maxGraphQLParallelism limits the resolvers of a query running at once
+	maxGraphQLParallelism = 16
+)
+
+// graphQLSchema is the read-only graph served by the gateway
+const graphQLSchema = `
+scalar Time
+
+schema {
+	query: Query
+}
+
+type Query {
+	hosts(status: [String!], lifecycle: [String!], search: String, first: Int = 50): [Host!]!
+	host(id: ID!): Host
+	clusters(status: String, first: Int = 50): [Cluster!]!
+	cluster(id: ID!): Cluster
+	alerts(status: String, severity: String, first: Int = 50): [Alert!]!
+}
+
+type Host {
+	id: ID!
+	hostname: String!
+	ipAddress: String!
+	status: String!
+	lifecycle: String!
+	osType: String!
+	osVersion: String!
+	cpuCores: Int
+	memoryGB: Int
+	tags: [String!]!
+	lastSeenAt: Time
+	createdAt: Time!
+	alerts(status: String, first: Int = 20): [Alert!]!
+}
+
+type Cluster {
+	id: ID!
+	name: String!
+	description: String!
+	type: String!
+	status: String!
+	provider: String!
+	region: String!
+	version: String!
+	nodeCount: Int!
+	lastConnectedAt: Time
+	createdAt: Time!
+	metrics: ClusterMetrics
+	deployments(namespace: String): [Deployment!]!
+	alerts(status: String, first: Int = 20): [Alert!]!
+}
+
+type ClusterMetrics {
+	timestamp: Time!
+	cpuUsagePercent: Float!
+	memoryUsagePercent: Float!
+	podCount: Int!
+	runningPodCount: Int!
+	pendingPodCount: Int!
+	failedPodCount: Int!
+	nodeCount: Int!
+	readyNodeCount: Int!
+	deploymentCount: Int!
+	unavailableDeploymentCount: Int!
+	crashLoopPodCount: Int!
+}
+
+type Deployment {
+	name: String!
+	namespace: String!
+	replicas: Int!
+	readyReplicas: Int!
+	availableReplicas: Int!
+	image: String!
+	createdAt: Time!
+}
+
+type Alert {
+	id: ID!
+	status: String!
+	severity: String!
+	title: String!
+	description: String!
+	value: Float!
+	threshold: Float!
+	startedAt: Time!
+	resolvedAt: Time
+	cluster: Cluster
+	host: Host
+}
+`
+
+// graphQLParams is a GraphQL request, sent as JSON or as GET query parameters
+type graphQLParams struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQLHandler serves read-only GraphQL queries, so pages can fetch hosts,
+// clusters, workloads and alerts together in the shape they show them
+type GraphQLHandler struct {
+	db     *gorm.DB
+	schema *graphql.Schema
+	logger *zap.Logger
+}
+
+// NewGraphQLHandler creates a new GraphQL handler
+func NewGraphQLHandler(db *gorm.DB, logger *zap.Logger) *GraphQLHandler {
+	schema := graphql.MustParseSchema(graphQLSchema, &graphQLResolver{},
+		graphql.MaxDepth(maxGraphQLDepth),
+		graphql.MaxParallelism(maxGraphQLParallelism),
+	)
+	return &GraphQLHandler{db: db, schema: schema, logger: logger}
+}
+
+// Query runs a GraphQL query as the calling user. Related objects are fetched
+// in batches, one query per type and level of the graph, whatever the number
+// of objects a list returns.
+func (h *GraphQLHandler) Query(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var params graphQLParams
+	if r.Method == http.MethodGet {
+		params.Query = r.URL.Query().Get("query")
+		params.OperationName = r.URL.Query().Get("operationName")
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &params.Variables); err != nil {
+				respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid variables")
+				return
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if params.Query == "" {
+		respondWithError(w, http.StatusBadRequest, "MISSING_FIELDS", "query is required")
+		return
+	}
+	if len(params.Query) > maxGraphQLQueryLength {
+		respondWithError(w, http.StatusBadRequest, "QUERY_TOO_LARGE",
+			fmt.Sprintf("A query is at most %d bytes", maxGraphQLQueryLength))
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), graphQLRequestKey{}, newGraphQLRequest(h.db, userID))
+	response := h.schema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+	if len(response.Errors) > 0 {
+		h.logger.Debug("graphql query returned errors", zap.String("operation", params.OperationName),
+			zap.Int("errors", len(response.Errors)))
+	}
+
+	// Errors are part of a GraphQL response, next to whatever data resolved
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
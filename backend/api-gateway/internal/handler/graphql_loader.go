@@ -0,0 +1,81 @@
+// Package handler provides the dataloader batching GraphQL lookups
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// loaderWait is how long a dataloader collects keys before fetching them. The
+// resolvers of a list run concurrently, so their keys arrive within it.
+const loaderWait = 2 * time.Millisecond
+
+// dataLoader batches the keys loaded while one GraphQL query resolves into a
+// single fetch, and keeps what it fetched for the rest of the query. Keys the
+// fetch returns nothing for load as the zero value.
+type dataLoader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending *loaderBatch[K, V]
+	batches map[K]*loaderBatch[K, V]
+}
+
+// loaderBatch is one fetch of a dataloader
+type loaderBatch[K comparable, V any] struct {
+	keys   []K
+	values map[K]V
+	err    error
+	done   chan struct{}
+}
+
+func newDataLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *dataLoader[K, V] {
+	return &dataLoader[K, V]{fetch: fetch, batches: make(map[K]*loaderBatch[K, V])}
+}
+
+// Load returns the value of key, fetching it with the other keys loaded at the
+// same time
+func (l *dataLoader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	batch, ok := l.batches[key]
+	if !ok {
+		if l.pending == nil {
+			l.pending = &loaderBatch[K, V]{done: make(chan struct{})}
+			go l.dispatch(ctx, l.pending)
+		}
+		batch = l.pending
+		batch.keys = append(batch.keys, key)
+		l.batches[key] = batch
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-batch.done:
+		return batch.values[key], batch.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// dispatch fetches batch once it has collected its keys
+func (l *dataLoader[K, V]) dispatch(ctx context.Context, batch *loaderBatch[K, V]) {
+	time.Sleep(loaderWait)
+	l.mu.Lock()
+	if l.pending == batch {
+		l.pending = nil
+	}
+	keys := batch.keys
+	l.mu.Unlock()
+
+	// A panicking fetch fails its batch instead of the gateway
+	defer close(batch.done)
+	defer func() {
+		if p := recover(); p != nil {
+			batch.err = fmt.Errorf("dataloader fetch panicked: %v", p)
+		}
+	}()
+	batch.values, batch.err = l.fetch(ctx, keys)
+}
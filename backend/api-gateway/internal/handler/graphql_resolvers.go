@@ -0,0 +1,535 @@
+// Package handler provides the resolvers of the GraphQL read gateway
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
+	"gorm.io/gorm"
+)
+
+const (
+	// graphQLDefaultFirst is how many items a list returns unless asked otherwise
+	graphQLDefaultFirst = 50
+	// graphQLMaxFirst caps the items of every list
+	graphQLMaxFirst = 100
+)
+
+// Alerts are loaded for clusters and hosts by one of these columns
+const (
+	alertsByCluster = "cluster_id"
+	alertsByHost    = "host_id"
+)
+
+// errHostsDenied is returned to callers without the permission to list hosts
+var errHostsDenied = errors.New("permission hosts.list required")
+
+// graphQLRequestKey is the context key of the graphQLRequest of a query
+type graphQLRequestKey struct{}
+
+// graphQLRequest holds the caller and the dataloaders of one GraphQL query. The
+// graph only reaches what the caller could list through the REST API: their own
+// clusters and alerts, and hosts when they hold hosts.list.
+type graphQLRequest struct {
+	db     *gorm.DB
+	userID uuid.UUID
+
+	hostsOnce    sync.Once
+	canListHosts bool
+
+	clusters    *dataLoader[uuid.UUID, *model.K8sCluster]
+	hosts       *dataLoader[uuid.UUID, *model.Host]
+	metrics     *dataLoader[uuid.UUID, *model.ClusterMetric]
+	alerts      *dataLoader[alertsKey, []model.Alert]
+	deployments *dataLoader[deploymentsKey, []k8s.DeploymentInfo]
+}
+
+// alertsKey selects the alerts of a cluster or host, optionally of one status
+type alertsKey struct {
+	Column  string
+	OwnerID uuid.UUID
+	Status  string
+}
+
+// deploymentsKey selects the deployments of a cluster namespace, or of every
+// namespace when Namespace is empty
+type deploymentsKey struct {
+	ClusterID uuid.UUID
+	Namespace string
+}
+
+func newGraphQLRequest(db *gorm.DB, userID uuid.UUID) *graphQLRequest {
+	q := &graphQLRequest{db: db, userID: userID}
+	q.clusters = newDataLoader(q.fetchClusters)
+	q.hosts = newDataLoader(q.fetchHosts)
+	q.metrics = newDataLoader(q.fetchMetrics)
+	q.alerts = newDataLoader(q.fetchAlerts)
+	q.deployments = newDataLoader(q.fetchDeployments)
+	return q
+}
+
+func graphQLRequestFrom(ctx context.Context) *graphQLRequest {
+	return ctx.Value(graphQLRequestKey{}).(*graphQLRequest)
+}
+
+// mayListHosts reports whether the caller holds hosts.list, checked once per query
+func (q *graphQLRequest) mayListHosts() bool {
+	q.hostsOnce.Do(func() {
+		q.canListHosts = model.UserHasPermission(q.db, q.userID, "hosts", "list", nil, "").Allowed
+	})
+	return q.canListHosts
+}
+
+func (q *graphQLRequest) fetchClusters(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*model.K8sCluster, error) {
+	var clusters []model.K8sCluster
+	if err := q.db.WithContext(ctx).Where("id IN ? AND user_id = ?", ids, q.userID).Find(&clusters).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*model.K8sCluster, len(clusters))
+	for i := range clusters {
+		byID[clusters[i].ID] = &clusters[i]
+	}
+	return byID, nil
+}
+
+func (q *graphQLRequest) fetchHosts(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*model.Host, error) {
+	if !q.mayListHosts() {
+		return nil, nil
+	}
+	var hosts []model.Host
+	if err := q.db.WithContext(ctx).Where("id IN ?", ids).Find(&hosts).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*model.Host, len(hosts))
+	for i := range hosts {
+		byID[hosts[i].ID] = &hosts[i]
+	}
+	return byID, nil
+}
+
+// fetchMetrics loads the latest metric snapshot of each cluster
+func (q *graphQLRequest) fetchMetrics(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*model.ClusterMetric, error) {
+	var metrics []model.ClusterMetric
+	err := q.db.WithContext(ctx).
+		Raw("SELECT DISTINCT ON (cluster_id) * FROM cluster_metrics WHERE cluster_id IN ? ORDER BY cluster_id, timestamp DESC", ids).
+		Scan(&metrics).Error
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*model.ClusterMetric, len(metrics))
+	for i := range metrics {
+		byID[metrics[i].ClusterID] = &metrics[i]
+	}
+	return byID, nil
+}
+
+// fetchAlerts loads the newest graphQLMaxFirst alerts of each cluster or host,
+// with one query per column and status
+func (q *graphQLRequest) fetchAlerts(ctx context.Context, keys []alertsKey) (map[alertsKey][]model.Alert, error) {
+	type group struct{ column, status string }
+	owners := make(map[group][]uuid.UUID)
+	for _, key := range keys {
+		g := group{key.Column, key.Status}
+		owners[g] = append(owners[g], key.OwnerID)
+	}
+
+	result := make(map[alertsKey][]model.Alert, len(keys))
+	for g, ids := range owners {
+		// The column is one of the alertsBy constants, never client input
+		ranked := q.db.Model(&model.Alert{}).
+			Select("alerts.*, ROW_NUMBER() OVER (PARTITION BY "+g.column+" ORDER BY started_at DESC) AS row_num").
+			Where("user_id = ? AND "+g.column+" IN ?", q.userID, ids)
+		if g.status != "" {
+			ranked = ranked.Where("status = ?", g.status)
+		}
+		var alerts []model.Alert
+		err := q.db.WithContext(ctx).Table("(?) AS ranked", ranked).
+			Where("row_num <= ?", graphQLMaxFirst).Order("started_at DESC").Find(&alerts).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, alert := range alerts {
+			owner := alert.ClusterID
+			if g.column == alertsByHost {
+				owner = alert.HostID
+			}
+			if owner != nil {
+				key := alertsKey{Column: g.column, OwnerID: *owner, Status: g.status}
+				result[key] = append(result[key], alert)
+			}
+		}
+	}
+	return result, nil
+}
+
+// fetchDeployments lists deployments with one client per cluster, querying the
+// clusters concurrently
+func (q *graphQLRequest) fetchDeployments(ctx context.Context, keys []deploymentsKey) (map[deploymentsKey][]k8s.DeploymentInfo, error) {
+	namespaces := make(map[uuid.UUID][]string)
+	ids := make([]uuid.UUID, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := namespaces[key.ClusterID]; !ok {
+			ids = append(ids, key.ClusterID)
+		}
+		namespaces[key.ClusterID] = append(namespaces[key.ClusterID], key.Namespace)
+	}
+	clusters, err := q.fetchClusters(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	result := make(map[deploymentsKey][]k8s.DeploymentInfo, len(keys))
+	for id, cluster := range clusters {
+		wg.Add(1)
+		go func(id uuid.UUID, cluster *model.K8sCluster) {
+			defer wg.Done()
+			client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+			if err == nil {
+				defer client.Close()
+			}
+			for _, namespace := range namespaces[id] {
+				var deployments []k8s.DeploymentInfo
+				if err == nil {
+					deployments, err = client.GetDeployments(ctx, namespace)
+				}
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("cluster %s: %w", cluster.Name, err)
+				}
+				result[deploymentsKey{ClusterID: id, Namespace: namespace}] = deployments
+				mu.Unlock()
+			}
+		}(id, cluster)
+	}
+	wg.Wait()
+	return result, firstErr
+}
+
+// graphQLResolver resolves the root query fields
+type graphQLResolver struct{}
+
+type firstArgs struct {
+	First int32
+}
+
+// limit returns the list length asked for, within graphQLMaxFirst
+func (a firstArgs) limit() int {
+	switch {
+	case a.First <= 0:
+		return graphQLDefaultFirst
+	case a.First > graphQLMaxFirst:
+		return graphQLMaxFirst
+	}
+	return int(a.First)
+}
+
+func (*graphQLResolver) Hosts(ctx context.Context, args struct {
+	Status    *[]string
+	Lifecycle *[]string
+	Search    *string
+	firstArgs
+}) ([]*hostResolver, error) {
+	q := graphQLRequestFrom(ctx)
+	if !q.mayListHosts() {
+		return nil, errHostsDenied
+	}
+	query := q.db.WithContext(ctx).Model(&model.Host{})
+	if args.Status != nil && len(*args.Status) > 0 {
+		if err := sanitize.OneOf(*args.Status, hostStatuses...); err != nil {
+			return nil, err
+		}
+		query = query.Where("status IN ?", *args.Status)
+	}
+	if args.Lifecycle != nil && len(*args.Lifecycle) > 0 {
+		if err := sanitize.OneOf(*args.Lifecycle, hostLifecycles...); err != nil {
+			return nil, err
+		}
+		query = query.Where("lifecycle IN ?", *args.Lifecycle)
+	}
+	if args.Search != nil && *args.Search != "" {
+		query = query.Where("hostname ILIKE ?", sanitize.Contains(*args.Search))
+	}
+	var hosts []model.Host
+	if err := query.Order("hostname").Limit(args.limit()).Find(&hosts).Error; err != nil {
+		return nil, err
+	}
+	resolvers := make([]*hostResolver, len(hosts))
+	for i := range hosts {
+		resolvers[i] = &hostResolver{host: &hosts[i]}
+	}
+	return resolvers, nil
+}
+
+func (*graphQLResolver) Host(ctx context.Context, args struct{ ID graphql.ID }) (*hostResolver, error) {
+	q := graphQLRequestFrom(ctx)
+	if !q.mayListHosts() {
+		return nil, errHostsDenied
+	}
+	id, err := uuid.Parse(string(args.ID))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host ID")
+	}
+	host, err := q.hosts.Load(ctx, id)
+	if host == nil || err != nil {
+		return nil, err
+	}
+	return &hostResolver{host: host}, nil
+}
+
+func (*graphQLResolver) Clusters(ctx context.Context, args struct {
+	Status *string
+	firstArgs
+}) ([]*clusterResolver, error) {
+	q := graphQLRequestFrom(ctx)
+	query := q.db.WithContext(ctx).Where("user_id = ?", q.userID)
+	if args.Status != nil && *args.Status != "" {
+		query = query.Where("status = ?", *args.Status)
+	}
+	var clusters []model.K8sCluster
+	if err := query.Order("name").Limit(args.limit()).Find(&clusters).Error; err != nil {
+		return nil, err
+	}
+	resolvers := make([]*clusterResolver, len(clusters))
+	for i := range clusters {
+		resolvers[i] = &clusterResolver{cluster: &clusters[i]}
+	}
+	return resolvers, nil
+}
+
+func (*graphQLResolver) Cluster(ctx context.Context, args struct{ ID graphql.ID }) (*clusterResolver, error) {
+	id, err := uuid.Parse(string(args.ID))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster ID")
+	}
+	cluster, err := graphQLRequestFrom(ctx).clusters.Load(ctx, id)
+	if cluster == nil || err != nil {
+		return nil, err
+	}
+	return &clusterResolver{cluster: cluster}, nil
+}
+
+func (*graphQLResolver) Alerts(ctx context.Context, args struct {
+	Status   *string
+	Severity *string
+	firstArgs
+}) ([]*alertResolver, error) {
+	q := graphQLRequestFrom(ctx)
+	query := q.db.WithContext(ctx).Where("user_id = ?", q.userID)
+	if args.Status != nil && *args.Status != "" {
+		query = query.Where("status = ?", *args.Status)
+	}
+	if args.Severity != nil && *args.Severity != "" {
+		query = query.Where("severity = ?", *args.Severity)
+	}
+	var alerts []model.Alert
+	if err := query.Order("started_at DESC").Limit(args.limit()).Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	return alertResolvers(alerts, args.limit()), nil
+}
+
+// ownedAlerts resolves the alerts field of a cluster or host
+func ownedAlerts(ctx context.Context, column string, ownerID uuid.UUID, status *string, first firstArgs) ([]*alertResolver, error) {
+	key := alertsKey{Column: column, OwnerID: ownerID}
+	if status != nil {
+		key.Status = *status
+	}
+	alerts, err := graphQLRequestFrom(ctx).alerts.Load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return alertResolvers(alerts, first.limit()), nil
+}
+
+func alertResolvers(alerts []model.Alert, limit int) []*alertResolver {
+	if len(alerts) > limit {
+		alerts = alerts[:limit]
+	}
+	resolvers := make([]*alertResolver, len(alerts))
+	for i := range alerts {
+		resolvers[i] = &alertResolver{alert: &alerts[i]}
+	}
+	return resolvers
+}
+
+// hostResolver resolves a model.Host
+type hostResolver struct {
+	host *model.Host
+}
+
+func (r *hostResolver) ID() graphql.ID            { return graphql.ID(r.host.ID.String()) }
+func (r *hostResolver) Hostname() string          { return r.host.Hostname }
+func (r *hostResolver) IPAddress() string         { return r.host.IPAddress }
+func (r *hostResolver) Status() string            { return string(r.host.Status) }
+func (r *hostResolver) Lifecycle() string         { return string(r.host.Lifecycle) }
+func (r *hostResolver) OSType() string            { return r.host.OSType }
+func (r *hostResolver) OSVersion() string         { return r.host.OSVersion }
+func (r *hostResolver) CPUCores() *int32          { return graphQLInt(r.host.CPUCores) }
+func (r *hostResolver) MemoryGB() *int32          { return graphQLInt(r.host.MemoryGB) }
+func (r *hostResolver) Tags() []string            { return []string(r.host.Tags) }
+func (r *hostResolver) LastSeenAt() *graphql.Time { return graphQLTime(r.host.LastSeenAt) }
+func (r *hostResolver) CreatedAt() graphql.Time   { return graphql.Time{Time: r.host.CreatedAt} }
+
+func (r *hostResolver) Alerts(ctx context.Context, args struct {
+	Status *string
+	firstArgs
+}) ([]*alertResolver, error) {
+	return ownedAlerts(ctx, alertsByHost, r.host.ID, args.Status, args.firstArgs)
+}
+
+// clusterResolver resolves a model.K8sCluster
+type clusterResolver struct {
+	cluster *model.K8sCluster
+}
+
+func (r *clusterResolver) ID() graphql.ID      { return graphql.ID(r.cluster.ID.String()) }
+func (r *clusterResolver) Name() string        { return r.cluster.Name }
+func (r *clusterResolver) Description() string { return r.cluster.Description }
+func (r *clusterResolver) Type() string        { return string(r.cluster.Type) }
+func (r *clusterResolver) Status() string      { return string(r.cluster.Status) }
+func (r *clusterResolver) Provider() string    { return r.cluster.Provider }
+func (r *clusterResolver) Region() string      { return r.cluster.Region }
+func (r *clusterResolver) Version() string     { return r.cluster.Version }
+func (r *clusterResolver) NodeCount() int32    { return r.cluster.NodeCount }
+func (r *clusterResolver) LastConnectedAt() *graphql.Time {
+	return graphQLTime(r.cluster.LastConnectedAt)
+}
+func (r *clusterResolver) CreatedAt() graphql.Time { return graphql.Time{Time: r.cluster.CreatedAt} }
+
+func (r *clusterResolver) Metrics(ctx context.Context) (*clusterMetricsResolver, error) {
+	metric, err := graphQLRequestFrom(ctx).metrics.Load(ctx, r.cluster.ID)
+	if metric == nil || err != nil {
+		return nil, err
+	}
+	return &clusterMetricsResolver{summary: clusterMetricSummary(metric)}, nil
+}
+
+func (r *clusterResolver) Deployments(ctx context.Context, args struct{ Namespace *string }) ([]*deploymentResolver, error) {
+	key := deploymentsKey{ClusterID: r.cluster.ID}
+	if args.Namespace != nil && *args.Namespace != "" {
+		if err := sanitize.ResourceName(*args.Namespace); err != nil {
+			return nil, err
+		}
+		key.Namespace = *args.Namespace
+	}
+	deployments, err := graphQLRequestFrom(ctx).deployments.Load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*deploymentResolver, len(deployments))
+	for i := range deployments {
+		resolvers[i] = &deploymentResolver{deployment: &deployments[i]}
+	}
+	return resolvers, nil
+}
+
+func (r *clusterResolver) Alerts(ctx context.Context, args struct {
+	Status *string
+	firstArgs
+}) ([]*alertResolver, error) {
+	return ownedAlerts(ctx, alertsByCluster, r.cluster.ID, args.Status, args.firstArgs)
+}
+
+// clusterMetricsResolver resolves the latest metric summary of a cluster
+type clusterMetricsResolver struct {
+	summary model.ClusterMetricSummary
+}
+
+func (r *clusterMetricsResolver) Timestamp() graphql.Time {
+	return graphql.Time{Time: time.Unix(r.summary.Timestamp, 0)}
+}
+func (r *clusterMetricsResolver) CPUUsagePercent() float64    { return r.summary.CPUUsagePercent }
+func (r *clusterMetricsResolver) MemoryUsagePercent() float64 { return r.summary.MemoryUsagePercent }
+func (r *clusterMetricsResolver) PodCount() int32             { return r.summary.PodCount }
+func (r *clusterMetricsResolver) RunningPodCount() int32      { return r.summary.RunningPodCount }
+func (r *clusterMetricsResolver) PendingPodCount() int32      { return r.summary.PendingPodCount }
+func (r *clusterMetricsResolver) FailedPodCount() int32       { return r.summary.FailedPodCount }
+func (r *clusterMetricsResolver) NodeCount() int32            { return r.summary.NodeCount }
+func (r *clusterMetricsResolver) ReadyNodeCount() int32       { return r.summary.ReadyNodeCount }
+func (r *clusterMetricsResolver) DeploymentCount() int32      { return r.summary.DeploymentCount }
+func (r *clusterMetricsResolver) UnavailableDeploymentCount() int32 {
+	return r.summary.UnavailableDeploymentCount
+}
+func (r *clusterMetricsResolver) CrashLoopPodCount() int32 { return r.summary.CrashLoopPodCount }
+
+// deploymentResolver resolves a deployment of a cluster
+type deploymentResolver struct {
+	deployment *k8s.DeploymentInfo
+}
+
+func (r *deploymentResolver) Name() string             { return r.deployment.Name }
+func (r *deploymentResolver) Namespace() string        { return r.deployment.Namespace }
+func (r *deploymentResolver) Replicas() int32          { return r.deployment.Replicas }
+func (r *deploymentResolver) ReadyReplicas() int32     { return r.deployment.ReadyReplicas }
+func (r *deploymentResolver) AvailableReplicas() int32 { return r.deployment.AvailableReplicas }
+func (r *deploymentResolver) Image() string            { return r.deployment.Image }
+func (r *deploymentResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.deployment.CreatedAt}
+}
+
+// alertResolver resolves a model.Alert
+type alertResolver struct {
+	alert *model.Alert
+}
+
+func (r *alertResolver) ID() graphql.ID            { return graphql.ID(r.alert.ID.String()) }
+func (r *alertResolver) Status() string            { return string(r.alert.Status) }
+func (r *alertResolver) Severity() string          { return string(r.alert.Severity) }
+func (r *alertResolver) Title() string             { return r.alert.Title }
+func (r *alertResolver) Description() string       { return r.alert.Description }
+func (r *alertResolver) Value() float64            { return r.alert.Value }
+func (r *alertResolver) Threshold() float64        { return r.alert.Threshold }
+func (r *alertResolver) StartedAt() graphql.Time   { return graphql.Time{Time: r.alert.StartedAt} }
+func (r *alertResolver) ResolvedAt() *graphql.Time { return graphQLTime(r.alert.ResolvedAt) }
+
+func (r *alertResolver) Cluster(ctx context.Context) (*clusterResolver, error) {
+	if r.alert.ClusterID == nil {
+		return nil, nil
+	}
+	cluster, err := graphQLRequestFrom(ctx).clusters.Load(ctx, *r.alert.ClusterID)
+	if cluster == nil || err != nil {
+		return nil, err
+	}
+	return &clusterResolver{cluster: cluster}, nil
+}
+
+// Host resolves the alert's host, which is null for callers who may not list hosts
+func (r *alertResolver) Host(ctx context.Context) (*hostResolver, error) {
+	if r.alert.HostID == nil {
+		return nil, nil
+	}
+	host, err := graphQLRequestFrom(ctx).hosts.Load(ctx, *r.alert.HostID)
+	if host == nil || err != nil {
+		return nil, err
+	}
+	return &hostResolver{host: host}, nil
+}
+
+func graphQLInt(v *int) *int32 {
+	if v == nil {
+		return nil
+	}
+	n := int32(*v)
+	return &n
+}
+
+func graphQLTime(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
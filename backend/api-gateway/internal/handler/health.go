@@ -19,17 +19,74 @@ var (
 	workloadHandler     *WorkloadHandler
 	podLogsWSHandler     *PodLogsWebSocketHandler
 	podTerminalWSHandler *PodTerminalWebSocketHandler
+	resourceWatchHandler *ResourceWatchHandler
 	helmHandler         *HelmHandler
+	appCatalogHandler   *AppCatalogHandler
+	gitOpsHandler       *GitOpsHandler
+	pipelineHandler     *DeploymentPipelineHandler
+	canaryHandler       *CanaryRolloutHandler
 	otelHandler         *OtelHandler
 	prometheusHandler   *PrometheusHandler
 	grafanaHandler      *GrafanaHandler
 	aiAnalysisHandler    *AIAnalysisHandler
 	alertHandler        *AlertHandler
+	alertGroupHandler   *AlertGroupHandler
+	maintenanceHandler  *MaintenanceHandler
+	runbookHandler      *RunbookHandler
+	webhookHandler      *WebhookHandler
+	ticketingHandler    *TicketingHandler
+	chatOpsHandler      *ChatOpsHandler
+	alertEmailHandler   *AlertEmailHandler
+	clusterConnectorHandler *ClusterConnectorHandler
+	clusterCredentialHandler *ClusterCredentialHandler
+	clusterKubeconfigHandler *ClusterKubeconfigHandler
+	upgradeAssessmentHandler *UpgradeAssessmentHandler
+	nodeMaintenanceHandler *NodeMaintenanceHandler
+	clusterFanoutHandler *ClusterFanoutHandler
+	clusterRBACHandler   *ClusterRBACHandler
+	portForwardHandler   *PortForwardHandler
+	imageHandler         *ImageHandler
+	complianceHandler    *ComplianceHandler
+	backupHandler        *BackupHandler
+	veleroHandler        *VeleroHandler
+	remoteWriteHandler  *RemoteWriteHandler
+	eventStreamHandler  *EventStreamHandler
+	topologyHandler     *TopologyHandler
+	searchHandler       *SearchHandler
+	tagHandler          *TagHandler
+	hostBulkHandler     *HostBulkHandler
+	hostLifecycleHandler *HostLifecycleHandler
+	healthCheckHandler  *HealthCheckHandler
+	diagnosticsHandler  *DiagnosticsHandler
+	settingsHandler     *SettingsHandler
+	featureFlagHandler  *FeatureFlagHandler
+	agentPluginHandler  *AgentPluginHandler
+	directorySyncHandler *DirectorySyncHandler
+	namespaceBindingHandler *NamespaceBindingHandler
+	permissionTraceHandler  *PermissionTraceHandler
+	accountHandler          *AccountHandler
+	quotaHandler            *QuotaHandler
+	dashboardShareHandler   *DashboardShareHandler
 	auditHandler        *AuditHandler
 	performanceHandler  *PerformanceHandler
 	notificationHandler *NotificationHandler
 	userManagementHandler *UserManagementHandler
 	rbacHandler         *RBACHandler
+	costHandler         *CostHandler
+	traceHandler        *TraceHandler
+	logHandler          *LogHandler
+	exploreHandler      *ExploreHandler
+	apiBatchHandler     *APIBatchHandler
+	graphQLHandler      *GraphQLHandler
+	operationHandler    *OperationHandler
+	jobQueueHandler     *JobQueueHandler
+	reportHandler       *ReportHandler
+	dataExportHandler   *DataExportHandler
+	annotationHandler   *AnnotationHandler
+	sloHandler          *SLOHandler
+	syntheticHandler    *SyntheticHandler
+	certificateHandler  *CertificateHandler
+	networkDiagnosticHandler *NetworkDiagnosticHandler
 )
 
 // RegisterHandlers registers the API handlers
@@ -64,6 +121,11 @@ func RegisterClusterMetricsHandler(metricsH *ClusterMetricsHandler) {
 	clusterMetricsHandler = metricsH
 }
 
+// RegisterCostHandler registers the cluster cost handler
+func RegisterCostHandler(costH *CostHandler) {
+	costHandler = costH
+}
+
 // RegisterWorkloadHandler registers the workload handler
 func RegisterWorkloadHandler(workloadH *WorkloadHandler) {
 	workloadHandler = workloadH
@@ -79,11 +141,36 @@ func RegisterPodTerminalWebSocketHandler(wsH *PodTerminalWebSocketHandler) {
 	podTerminalWSHandler = wsH
 }
 
+// RegisterResourceWatchHandler registers the resource watch websocket handler
+func RegisterResourceWatchHandler(watchH *ResourceWatchHandler) {
+	resourceWatchHandler = watchH
+}
+
 // RegisterHelmHandler registers the Helm handler
 func RegisterHelmHandler(helmH *HelmHandler) {
 	helmHandler = helmH
 }
 
+// RegisterAppCatalogHandler registers the app catalog handler
+func RegisterAppCatalogHandler(catalogH *AppCatalogHandler) {
+	appCatalogHandler = catalogH
+}
+
+// RegisterGitOpsHandler registers the GitOps handler
+func RegisterGitOpsHandler(gitOpsH *GitOpsHandler) {
+	gitOpsHandler = gitOpsH
+}
+
+// RegisterDeploymentPipelineHandler registers the deployment pipeline handler
+func RegisterDeploymentPipelineHandler(pipelineH *DeploymentPipelineHandler) {
+	pipelineHandler = pipelineH
+}
+
+// RegisterCanaryRolloutHandler registers the canary rollout handler
+func RegisterCanaryRolloutHandler(canaryH *CanaryRolloutHandler) {
+	canaryHandler = canaryH
+}
+
 // RegisterOtelHandler registers the OpenTelemetry handler
 func RegisterOtelHandler(otelH *OtelHandler) {
 	otelHandler = otelH
@@ -99,6 +186,21 @@ func RegisterGrafanaHandler(grafanaH *GrafanaHandler) {
 	grafanaHandler = grafanaH
 }
 
+// RegisterTraceHandler registers the trace handler
+func RegisterTraceHandler(traceH *TraceHandler) {
+	traceHandler = traceH
+}
+
+// RegisterLogHandler registers the log handler
+func RegisterLogHandler(logH *LogHandler) {
+	logHandler = logH
+}
+
+// RegisterExploreHandler registers the explore handler
+func RegisterExploreHandler(exploreH *ExploreHandler) {
+	exploreHandler = exploreH
+}
+
 // RegisterAIAnalysisHandler registers the AI analysis handler
 func RegisterAIAnalysisHandler(aiH *AIAnalysisHandler) {
 	aiAnalysisHandler = aiH
@@ -109,6 +211,191 @@ func RegisterAlertHandler(alertH *AlertHandler) {
 	alertHandler = alertH
 }
 
+// RegisterAlertGroupHandler registers the alert group handler
+func RegisterAlertGroupHandler(alertGroupH *AlertGroupHandler) {
+	alertGroupHandler = alertGroupH
+}
+
+// RegisterMaintenanceHandler registers the maintenance window handler
+func RegisterMaintenanceHandler(maintenanceH *MaintenanceHandler) {
+	maintenanceHandler = maintenanceH
+}
+
+// RegisterRunbookHandler registers the runbook handler
+func RegisterRunbookHandler(runbookH *RunbookHandler) {
+	runbookHandler = runbookH
+}
+
+// RegisterWebhookHandler registers the webhook handler
+func RegisterWebhookHandler(webhookH *WebhookHandler) {
+	webhookHandler = webhookH
+}
+
+// RegisterTicketingHandler registers the ticketing integration handler
+func RegisterTicketingHandler(ticketingH *TicketingHandler) {
+	ticketingHandler = ticketingH
+}
+
+// RegisterChatOpsHandler registers the ChatOps handler
+func RegisterChatOpsHandler(chatOpsH *ChatOpsHandler) {
+	chatOpsHandler = chatOpsH
+}
+
+// RegisterAlertEmailHandler registers the alert email reply handler
+func RegisterAlertEmailHandler(alertEmailH *AlertEmailHandler) {
+	alertEmailHandler = alertEmailH
+}
+
+// RegisterClusterConnectorHandler registers the in-cluster connector handler
+func RegisterClusterConnectorHandler(connectorH *ClusterConnectorHandler) {
+	clusterConnectorHandler = connectorH
+}
+
+// RegisterClusterCredentialHandler registers the cluster credential handler
+func RegisterClusterCredentialHandler(credentialH *ClusterCredentialHandler) {
+	clusterCredentialHandler = credentialH
+}
+
+// RegisterClusterKubeconfigHandler registers the scoped kubeconfig handler
+func RegisterClusterKubeconfigHandler(kubeconfigH *ClusterKubeconfigHandler) {
+	clusterKubeconfigHandler = kubeconfigH
+}
+
+// RegisterUpgradeAssessmentHandler registers the cluster upgrade assessment handler
+func RegisterUpgradeAssessmentHandler(assessmentH *UpgradeAssessmentHandler) {
+	upgradeAssessmentHandler = assessmentH
+}
+
+// RegisterNodeMaintenanceHandler registers the node maintenance handler
+func RegisterNodeMaintenanceHandler(maintenanceH *NodeMaintenanceHandler) {
+	nodeMaintenanceHandler = maintenanceH
+}
+
+// RegisterClusterFanoutHandler registers the cluster fan-out query handler
+func RegisterClusterFanoutHandler(fanoutH *ClusterFanoutHandler) {
+	clusterFanoutHandler = fanoutH
+}
+
+// RegisterClusterRBACHandler registers the Kubernetes RBAC handler
+func RegisterClusterRBACHandler(rbacH *ClusterRBACHandler) {
+	clusterRBACHandler = rbacH
+}
+
+// RegisterPortForwardHandler registers the pod port-forward handler
+func RegisterPortForwardHandler(portForwardH *PortForwardHandler) {
+	portForwardHandler = portForwardH
+}
+
+// RegisterImageHandler registers the container image handler
+func RegisterImageHandler(imageH *ImageHandler) {
+	imageHandler = imageH
+}
+
+// RegisterComplianceHandler registers the compliance scan handler
+func RegisterComplianceHandler(complianceH *ComplianceHandler) {
+	complianceHandler = complianceH
+}
+
+// RegisterBackupHandler registers the platform backup handler
+func RegisterBackupHandler(backupH *BackupHandler) {
+	backupHandler = backupH
+}
+
+// RegisterVeleroHandler registers the Velero cluster backup handler
+func RegisterVeleroHandler(veleroH *VeleroHandler) {
+	veleroHandler = veleroH
+}
+
+// RegisterRemoteWriteHandler registers the remote_write target handler
+func RegisterRemoteWriteHandler(remoteWriteH *RemoteWriteHandler) {
+	remoteWriteHandler = remoteWriteH
+}
+
+// RegisterEventStreamHandler registers the event stream websocket handler
+func RegisterEventStreamHandler(streamH *EventStreamHandler) {
+	eventStreamHandler = streamH
+}
+
+// RegisterTopologyHandler registers the topology map handler
+func RegisterTopologyHandler(topologyH *TopologyHandler) {
+	topologyHandler = topologyH
+}
+
+// RegisterSearchHandler registers the global search handler
+func RegisterSearchHandler(searchH *SearchHandler) {
+	searchHandler = searchH
+}
+
+// RegisterTagHandler registers the resource tag handler
+func RegisterTagHandler(tagH *TagHandler) {
+	tagHandler = tagH
+}
+
+// RegisterHostBulkHandler registers the bulk host action handler
+func RegisterHostBulkHandler(bulkH *HostBulkHandler) {
+	hostBulkHandler = bulkH
+}
+
+// RegisterHostLifecycleHandler registers the host lifecycle handler
+func RegisterHostLifecycleHandler(lifecycleH *HostLifecycleHandler) {
+	hostLifecycleHandler = lifecycleH
+}
+
+// RegisterHealthCheckHandler registers the component health handler
+func RegisterHealthCheckHandler(healthH *HealthCheckHandler) {
+	healthCheckHandler = healthH
+}
+
+// RegisterDiagnosticsHandler registers the admin diagnostics bundle handler
+func RegisterDiagnosticsHandler(diagnosticsH *DiagnosticsHandler) {
+	diagnosticsHandler = diagnosticsH
+}
+
+// RegisterSettingsHandler registers the runtime settings handler
+func RegisterSettingsHandler(settingsH *SettingsHandler) {
+	settingsHandler = settingsH
+}
+
+// RegisterFeatureFlagHandler registers the feature flag handler
+func RegisterFeatureFlagHandler(flagH *FeatureFlagHandler) {
+	featureFlagHandler = flagH
+}
+
+// RegisterAgentPluginHandler registers the agent plugin handler
+func RegisterAgentPluginHandler(pluginH *AgentPluginHandler) {
+	agentPluginHandler = pluginH
+}
+
+// RegisterDirectorySyncHandler registers the directory sync handler
+func RegisterDirectorySyncHandler(syncH *DirectorySyncHandler) {
+	directorySyncHandler = syncH
+}
+
+// RegisterNamespaceBindingHandler registers the namespace binding handler
+func RegisterNamespaceBindingHandler(bindingH *NamespaceBindingHandler) {
+	namespaceBindingHandler = bindingH
+}
+
+// RegisterPermissionTraceHandler registers the permission trace handler
+func RegisterPermissionTraceHandler(traceH *PermissionTraceHandler) {
+	permissionTraceHandler = traceH
+}
+
+// RegisterAccountHandler registers the account lifecycle handler
+func RegisterAccountHandler(accountH *AccountHandler) {
+	accountHandler = accountH
+}
+
+// RegisterQuotaHandler registers the quota handler
+func RegisterQuotaHandler(quotaH *QuotaHandler) {
+	quotaHandler = quotaH
+}
+
+// RegisterDashboardShareHandler registers the dashboard share link handler
+func RegisterDashboardShareHandler(shareH *DashboardShareHandler) {
+	dashboardShareHandler = shareH
+}
+
 // RegisterAuditHandler registers the audit handler
 func RegisterAuditHandler(auditH *AuditHandler) {
 	auditHandler = auditH
@@ -134,6 +421,61 @@ func RegisterRBACHandler(rbacH *RBACHandler) {
 	rbacHandler = rbacH
 }
 
+// RegisterAPIBatchHandler registers the batch request handler
+func RegisterAPIBatchHandler(batchH *APIBatchHandler) {
+	apiBatchHandler = batchH
+}
+
+// RegisterGraphQLHandler registers the GraphQL read gateway
+func RegisterGraphQLHandler(graphQLH *GraphQLHandler) {
+	graphQLHandler = graphQLH
+}
+
+// RegisterOperationHandler registers the long-running operation handler
+func RegisterOperationHandler(operationH *OperationHandler) {
+	operationHandler = operationH
+}
+
+// RegisterJobQueueHandler registers the job queue handler
+func RegisterJobQueueHandler(jobQueueH *JobQueueHandler) {
+	jobQueueHandler = jobQueueH
+}
+
+// RegisterReportHandler registers the report handler
+func RegisterReportHandler(reportH *ReportHandler) {
+	reportHandler = reportH
+}
+
+// RegisterDataExportHandler registers the data export handler
+func RegisterDataExportHandler(dataExportH *DataExportHandler) {
+	dataExportHandler = dataExportH
+}
+
+// RegisterAnnotationHandler registers the annotation handler
+func RegisterAnnotationHandler(annotationH *AnnotationHandler) {
+	annotationHandler = annotationH
+}
+
+// RegisterSLOHandler registers the SLO handler
+func RegisterSLOHandler(sloH *SLOHandler) {
+	sloHandler = sloH
+}
+
+// RegisterSyntheticHandler registers the synthetic check handler
+func RegisterSyntheticHandler(syntheticH *SyntheticHandler) {
+	syntheticHandler = syntheticH
+}
+
+// RegisterCertificateHandler registers the certificate handler
+func RegisterCertificateHandler(certificateH *CertificateHandler) {
+	certificateHandler = certificateH
+}
+
+// RegisterNetworkDiagnosticHandler registers the network diagnostic handler
+func RegisterNetworkDiagnosticHandler(networkDiagnosticH *NetworkDiagnosticHandler) {
+	networkDiagnosticHandler = networkDiagnosticH
+}
+
 // Health returns the health check response
 func Health(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -151,6 +493,59 @@ func API(w http.ResponseWriter, r *http.Request) {
 	method := r.Method
 
 	// Route to appropriate handler
+	if strings.HasPrefix(path, "/api/v1/agent/commands") {
+		// Agent command channel
+		if agentHandler == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Agent service not available")
+			return
+		}
+		switch {
+		case path == "/api/v1/agent/commands" && method == http.MethodGet:
+			agentHandler.PollCommands(w, r)
+		case matchesPattern(path, "/api/v1/agent/commands/*/result") && method == http.MethodPost:
+			agentHandler.SubmitCommandResult(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Agent operation not found")
+		}
+		return
+	}
+
+	if path == "/api/v1/batch" {
+		// Several GET requests in one round trip
+		if apiBatchHandler == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Batch requests not available")
+		} else if method != http.MethodPost {
+			respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		} else {
+			apiBatchHandler.Batch(w, r)
+		}
+		return
+	}
+
+	if path == "/api/v1/graphql" {
+		// Read-only queries across hosts, clusters, workloads and alerts
+		if graphQLHandler == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "GraphQL gateway not available")
+		} else if method != http.MethodGet && method != http.MethodPost {
+			respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		} else {
+			graphQLHandler.Query(w, r)
+		}
+		return
+	}
+
+	if path == "/api/v1/agent/reports" {
+		// Reports buffered by an agent while the gateway was unreachable
+		if agentHandler == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Agent service not available")
+		} else if method != http.MethodPost {
+			respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		} else {
+			agentHandler.ReportBatch(w, r)
+		}
+		return
+	}
+
 	if strings.HasPrefix(path, "/api/v1/agent/report") {
 		// Agent reporting endpoint
 		if agentHandler != nil {
@@ -161,6 +556,16 @@ func API(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if path == "/api/v1/hosts/scan" {
+		// Network scans for hosts, run as operations
+		if scanHandler != nil {
+			scanHandler.ServeHTTP(w, r)
+		} else {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Scan service not available")
+		}
+		return
+	}
+
 	if strings.HasPrefix(path, "/api/v1/hosts/scan-tasks/") {
 		// Scan task status query
 		if scanHandler != nil {
@@ -187,202 +592,1171 @@ func API(w http.ResponseWriter, r *http.Request) {
 		case path == "/api/v1/files/transfers" && method == http.MethodGet:
 			fileHandler.GetTransfers(w, r)
 		default:
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "File operation not found")
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "File operation not found")
+		}
+		return
+	}
+
+	// Host-specific file transfer endpoints
+	if matchesPattern(path, "/api/v1/hosts/*/transfers") && method == http.MethodGet {
+		if fileHandler != nil {
+			fileHandler.GetTransfers(w, r)
+		} else {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "File service not available")
+		}
+		return
+	}
+
+	// Process management endpoints
+	if strings.HasPrefix(path, "/api/v1/processes/") && processHandler != nil {
+		switch {
+		case path == "/api/v1/processes/list" && method == http.MethodPost:
+			processHandler.ListProcesses(w, r)
+		case path == "/api/v1/processes/get" && method == http.MethodPost:
+			processHandler.GetProcess(w, r)
+		case path == "/api/v1/processes/kill" && method == http.MethodPost:
+			processHandler.KillProcess(w, r)
+		case path == "/api/v1/processes/renice" && method == http.MethodPost:
+			processHandler.ReniceProcess(w, r)
+		case path == "/api/v1/processes/ionice" && method == http.MethodPost:
+			processHandler.IoniceProcess(w, r)
+		case path == "/api/v1/processes/execute" && method == http.MethodPost:
+			processHandler.ExecuteCommand(w, r)
+		case path == "/api/v1/processes/executions" && method == http.MethodGet:
+			processHandler.GetExecutions(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Process operation not found")
+		}
+		return
+	}
+
+	// Host-specific process execution endpoints
+	if matchesPattern(path, "/api/v1/hosts/*/executions") && method == http.MethodGet {
+		if processHandler != nil {
+			processHandler.GetExecutions(w, r)
+		} else {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Process service not available")
+		}
+		return
+	}
+
+	// Host service control endpoints
+	if matchesPattern(path, "/api/v1/hosts/*/services") || strings.HasPrefix(path, "/api/v1/hosts/") && strings.Contains(path, "/services/") {
+		if processHandler == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Process service not available")
+			return
+		}
+		switch {
+		case matchesPattern(path, "/api/v1/hosts/*/services") && method == http.MethodGet:
+			processHandler.ListServices(w, r)
+		case matchesPattern(path, "/api/v1/hosts/*/services/*") && method == http.MethodGet:
+			processHandler.GetService(w, r)
+		case matchesPattern(path, "/api/v1/hosts/*/services/*/*") && method == http.MethodPost:
+			processHandler.ControlService(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Service operation not found")
+		}
+		return
+	}
+
+	// Host plugin data endpoints
+	if matchesPattern(path, "/api/v1/hosts/*/plugins") && method == http.MethodGet {
+		if agentPluginHandler == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Agent plugin service not available")
+			return
+		}
+		agentPluginHandler.GetHostPluginData(w, r)
+		return
+	}
+
+	if matchesPattern(path, "/api/v1/hosts/*/anomalies") && method == http.MethodGet {
+		if aiAnalysisHandler == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "AI analysis service not available")
+			return
+		}
+		aiAnalysisHandler.ListHostAnomalies(w, r)
+		return
+	}
+
+	// Host crontab and systemd timer endpoints
+	if matchesPattern(path, "/api/v1/hosts/*/crontab") || matchesPattern(path, "/api/v1/hosts/*/crontab/*") {
+		if processHandler == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Process service not available")
+			return
+		}
+		switch {
+		case matchesPattern(path, "/api/v1/hosts/*/crontab") && method == http.MethodGet:
+			processHandler.GetCrontab(w, r)
+		case matchesPattern(path, "/api/v1/hosts/*/crontab") && method == http.MethodPost:
+			processHandler.CreateCrontabEntry(w, r)
+		case matchesPattern(path, "/api/v1/hosts/*/crontab/validate") && method == http.MethodPost:
+			processHandler.ValidateSchedule(w, r)
+		case matchesPattern(path, "/api/v1/hosts/*/crontab/*") && method == http.MethodPut:
+			processHandler.UpdateCrontabEntry(w, r)
+		case matchesPattern(path, "/api/v1/hosts/*/crontab/*") && method == http.MethodDelete:
+			processHandler.DeleteCrontabEntry(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Crontab operation not found")
+		}
+		return
+	}
+
+	// Batch task endpoints
+	if strings.HasPrefix(path, "/api/v1/batch-tasks") && batchTaskHandler != nil {
+		switch {
+		case path == "/api/v1/batch-tasks" && method == http.MethodPost:
+			batchTaskHandler.CreateBatchTask(w, r)
+		case path == "/api/v1/batch-tasks" && method == http.MethodGet:
+			batchTaskHandler.ListBatchTasks(w, r)
+		case path == "/api/v1/batch-tasks/execute" && method == http.MethodPost:
+			batchTaskHandler.ExecuteBatchTask(w, r)
+		case path == "/api/v1/batch-tasks/cancel" && method == http.MethodPost:
+			batchTaskHandler.CancelBatchTask(w, r)
+		case path == "/api/v1/batch-tasks/distributions" && method == http.MethodPost:
+			batchTaskHandler.CreateFileDistribution(w, r)
+		case matchesPattern(path, "/api/v1/batch-tasks/*/distribution") && method == http.MethodGet:
+			batchTaskHandler.GetFileDistribution(w, r)
+		case matchesPattern(path, "/api/v1/batch-tasks/*"):
+			if method == http.MethodGet {
+				batchTaskHandler.GetBatchTask(w, r)
+			} else if method == http.MethodDelete {
+				batchTaskHandler.DeleteBatchTask(w, r)
+			} else {
+				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Batch task operation not found")
+			}
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Batch task operation not found")
+		}
+		return
+	}
+
+	// Cluster management endpoints
+	if strings.HasPrefix(path, "/api/v1/clusters") && clusterHandler != nil {
+		// Check for metrics endpoints first
+		if clusterMetricsHandler != nil {
+			switch {
+			case matchesPattern(path, "/api/v1/clusters/*/metrics") && method == http.MethodGet:
+				clusterMetricsHandler.GetClusterMetrics(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/metrics/summary") && method == http.MethodGet:
+				clusterMetricsHandler.GetClusterMetricsSummary(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/metrics/live") && method == http.MethodGet:
+				clusterMetricsHandler.GetLiveClusterMetrics(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/refresh") && method == http.MethodPost:
+				clusterMetricsHandler.RefreshMetrics(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/capacity") && method == http.MethodGet:
+				clusterMetricsHandler.GetClusterCapacity(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/namespaces") && method == http.MethodGet:
+				clusterMetricsHandler.ListNamespaces(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/metrics") && method == http.MethodGet:
+				clusterMetricsHandler.GetPodMetrics(w, r)
+				return
+			case matchesPattern(path, "/api/v1/nodes/*/metrics") && method == http.MethodGet:
+				clusterMetricsHandler.GetNodeMetrics(w, r)
+				return
+			case matchesPattern(path, "/api/v1/nodes/*/live-metrics") && method == http.MethodGet:
+				clusterMetricsHandler.GetLiveNodeMetrics(w, r)
+				return
+			}
+		}
+
+		// In-cluster connector endpoints
+		if clusterConnectorHandler != nil {
+			switch {
+			case path == "/api/v1/clusters/connectors" && method == http.MethodPost:
+				clusterConnectorHandler.CreateCluster(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/connector") && method == http.MethodGet:
+				clusterConnectorHandler.GetStatus(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/connector/manifest") && method == http.MethodPost:
+				clusterConnectorHandler.GenerateManifest(w, r)
+				return
+			}
+		}
+
+		// Queries across clusters
+		if path == "/api/v1/clusters/fanout" && method == http.MethodPost && clusterFanoutHandler != nil {
+			clusterFanoutHandler.Query(w, r)
+			return
+		}
+
+		// Port-forward sessions
+		if portForwardHandler != nil {
+			switch {
+			case path == "/api/v1/clusters/port-forwards" && method == http.MethodGet:
+				portForwardHandler.ListSessions(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/port-forwards/*") && method == http.MethodDelete:
+				portForwardHandler.TerminateSession(w, r)
+				return
+			}
+		}
+
+		// Kubernetes RBAC of the cluster itself
+		if clusterRBACHandler != nil {
+			switch {
+			case matchesPattern(path, "/api/v1/clusters/*/rbac") && method == http.MethodGet:
+				clusterRBACHandler.ListRBAC(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/rbac/who-can") && method == http.MethodGet:
+				clusterRBACHandler.WhoCan(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/rbac/access-review") && method == http.MethodPost:
+				clusterRBACHandler.ReviewAccess(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/rbac/generate") && method == http.MethodPost:
+				clusterRBACHandler.GenerateRole(w, r)
+				return
+			}
+		}
+
+		// Velero backups of the cluster's resources
+		if veleroHandler != nil && strings.Contains(path, "/velero") {
+			switch {
+			case matchesPattern(path, "/api/v1/clusters/*/velero") && method == http.MethodGet:
+				veleroHandler.GetStatus(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/velero") && method == http.MethodPut:
+				veleroHandler.Install(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/velero/backups") && method == http.MethodGet:
+				veleroHandler.ListBackups(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/velero/backups") && method == http.MethodPost:
+				veleroHandler.CreateBackup(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/velero/backups/*") && method == http.MethodGet:
+				veleroHandler.GetBackup(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/velero/backups/*") && method == http.MethodDelete:
+				veleroHandler.DeleteBackup(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/velero/restores") && method == http.MethodGet:
+				veleroHandler.ListRestores(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/velero/restores") && method == http.MethodPost:
+				veleroHandler.CreateRestore(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/velero/schedules") && method == http.MethodGet:
+				veleroHandler.ListSchedules(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/velero/schedules") && method == http.MethodPost:
+				veleroHandler.CreateSchedule(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/velero/schedules/*") && method == http.MethodPut:
+				veleroHandler.UpdateSchedule(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/velero/schedules/*") && method == http.MethodDelete:
+				veleroHandler.DeleteSchedule(w, r)
+				return
+			}
+		}
+
+		// Kubeconfig credential endpoints
+		if clusterCredentialHandler != nil {
+			switch {
+			case matchesPattern(path, "/api/v1/clusters/*/credentials") && method == http.MethodGet:
+				clusterCredentialHandler.GetCredentials(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/credentials/rotate") && method == http.MethodPost:
+				clusterCredentialHandler.RotateCredentials(w, r)
+				return
+			}
+		}
+
+		// Scoped kubeconfigs for users
+		if clusterKubeconfigHandler != nil {
+			switch {
+			case matchesPattern(path, "/api/v1/clusters/*/kubeconfig") && method == http.MethodPost:
+				clusterKubeconfigHandler.IssueKubeconfig(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/kubeconfig") && method == http.MethodDelete:
+				clusterKubeconfigHandler.RevokeKubeconfig(w, r)
+				return
+			}
+		}
+
+		// Deprecated API assessments ahead of upgrades
+		if upgradeAssessmentHandler != nil {
+			switch {
+			case matchesPattern(path, "/api/v1/clusters/*/upgrade-assessments") && method == http.MethodPost:
+				upgradeAssessmentHandler.RunAssessment(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/upgrade-assessments") && method == http.MethodGet:
+				upgradeAssessmentHandler.ListAssessments(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/upgrade-assessments/*") && method == http.MethodGet:
+				upgradeAssessmentHandler.GetAssessment(w, r)
+				return
+			}
+		}
+
+		// Node maintenance
+		if nodeMaintenanceHandler != nil && method == http.MethodPost {
+			switch {
+			case matchesPattern(path, "/api/v1/clusters/*/nodes/*/cordon"):
+				nodeMaintenanceHandler.CordonNode(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/nodes/*/uncordon"):
+				nodeMaintenanceHandler.UncordonNode(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/nodes/*/drain"):
+				nodeMaintenanceHandler.DrainNode(w, r)
+				return
+			}
+		}
+
+		// Cost endpoints
+		if costHandler != nil {
+			switch {
+			case matchesPattern(path, "/api/v1/clusters/*/costs") && method == http.MethodGet:
+				costHandler.GetClusterCosts(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/costs/trend") && method == http.MethodGet:
+				costHandler.GetCostTrend(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/costs/pricing") && method == http.MethodGet:
+				costHandler.GetPricing(w, r)
+				return
+			case matchesPattern(path, "/api/v1/clusters/*/costs/pricing") && method == http.MethodPut:
+				costHandler.UpdatePricing(w, r)
+				return
+			}
+		}
+
+		switch {
+		case path == "/api/v1/clusters" && method == http.MethodPost:
+			clusterHandler.CreateCluster(w, r)
+		case path == "/api/v1/clusters" && method == http.MethodGet:
+			clusterHandler.ListClusters(w, r)
+		case path == "/api/v1/clusters/test-connection" && method == http.MethodPost:
+			clusterHandler.TestConnection(w, r)
+		case matchesPattern(path, "/api/v1/clusters/*/nodes") && method == http.MethodGet:
+			clusterHandler.GetClusterNodes(w, r)
+		case matchesPattern(path, "/api/v1/clusters/*/info") && method == http.MethodGet:
+			clusterHandler.GetClusterInfo(w, r)
+		case matchesPattern(path, "/api/v1/clusters/*"):
+			if method == http.MethodGet {
+				clusterHandler.GetCluster(w, r)
+			} else if method == http.MethodPut {
+				clusterHandler.UpdateCluster(w, r)
+			} else if method == http.MethodDelete {
+				clusterHandler.DeleteCluster(w, r)
+			} else {
+				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster operation not found")
+			}
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster operation not found")
+		}
+		return
+	}
+
+	// Workload management endpoints
+	if strings.HasPrefix(path, "/api/v1/clusters") && workloadHandler != nil {
+		// Websocket endpoint for pod logs streaming
+		if path == "/api/v1/clusters/pod-logs/ws" && method == http.MethodGet {
+			if podLogsWSHandler != nil {
+				podLogsWSHandler.ServeHTTP(w, r)
+			} else {
+				respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "WebSocket service not available")
+			}
+			return
+		}
+
+		// Websocket endpoint for live pod, deployment and event changes
+		if path == "/api/v1/clusters/watch/ws" && method == http.MethodGet {
+			if resourceWatchHandler != nil {
+				resourceWatchHandler.ServeHTTP(w, r)
+			} else {
+				respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "WebSocket service not available")
+			}
+			return
+		}
+
+		// Websocket endpoint for pod terminal
+		if path == "/api/v1/clusters/pod-terminal/ws" && method == http.MethodGet {
+			if podTerminalWSHandler != nil {
+				podTerminalWSHandler.ServeHTTP(w, r)
+			} else {
+				respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "WebSocket service not available")
+			}
+			return
+		}
+
+		// Websocket endpoint for pod and service port-forwarding
+		if path == "/api/v1/clusters/pod-portforward/ws" && method == http.MethodGet {
+			if portForwardHandler != nil {
+				portForwardHandler.ServeHTTP(w, r)
+			} else {
+				respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "WebSocket service not available")
+			}
+			return
+		}
+
+		switch {
+		case matchesPattern(path, "/api/v1/clusters/*/namespaces") && method == http.MethodGet:
+			workloadHandler.ListNamespaces(w, r)
+			return
+		case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/deployments") && method == http.MethodGet:
+			workloadHandler.ListDeployments(w, r)
+			return
+		case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/pods") && method == http.MethodGet:
+			workloadHandler.ListPods(w, r)
+			return
+		case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/pods/*/detail") && method == http.MethodGet:
+			workloadHandler.GetPodDetail(w, r)
+			return
+		case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/pods/*/logs") && method == http.MethodGet:
+			workloadHandler.GetPodLogs(w, r)
+			return
+		case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/pods/*") && method == http.MethodDelete:
+			workloadHandler.DeletePod(w, r)
+			return
+		case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/services") && method == http.MethodGet:
+			workloadHandler.ListServices(w, r)
+			return
+		}
+	}
+
+	// Host lifecycle, agent token and archive endpoints
+	if hostLifecycleHandler != nil {
+		switch {
+		case matchesPattern(path, "/api/v1/hosts/*/lifecycle") && method == http.MethodGet:
+			hostLifecycleHandler.GetLifecycle(w, r)
+			return
+		case matchesPattern(path, "/api/v1/hosts/*/lifecycle") && method == http.MethodPut:
+			hostLifecycleHandler.SetLifecycle(w, r)
+			return
+		case matchesPattern(path, "/api/v1/hosts/*/agent-token") && method == http.MethodPost:
+			hostLifecycleHandler.IssueAgentToken(w, r)
+			return
+		case path == "/api/v1/host-archives" && method == http.MethodGet:
+			hostLifecycleHandler.ListArchives(w, r)
+			return
+		case matchesPattern(path, "/api/v1/host-archives/*") && method == http.MethodGet:
+			hostLifecycleHandler.GetArchive(w, r)
+			return
+		}
+	}
+
+	if strings.HasPrefix(path, "/api/v1/hosts/bulk/") && hostBulkHandler != nil {
+		switch {
+		case path == "/api/v1/hosts/bulk/approvals" && method == http.MethodGet:
+			hostBulkHandler.ListApprovals(w, r)
+		case matchesPattern(path, "/api/v1/hosts/bulk/approvals/*") && method == http.MethodGet:
+			hostBulkHandler.GetApproval(w, r)
+		case matchesPattern(path, "/api/v1/hosts/bulk/approvals/*/approve") && method == http.MethodPost:
+			hostBulkHandler.ApproveApproval(w, r)
+		case matchesPattern(path, "/api/v1/hosts/bulk/approvals/*/reject") && method == http.MethodPost:
+			hostBulkHandler.RejectApproval(w, r)
+		case matchesPattern(path, "/api/v1/hosts/bulk/*") && method == http.MethodPost:
+			hostBulkHandler.Apply(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Bulk host endpoint not found")
+		}
+		return
+	}
+
+	if strings.HasPrefix(path, "/api/v1/hosts") {
+		// Host management endpoints
+		if hostHandler != nil {
+			hostHandler.ServeHTTP(w, r)
+		} else {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Host service not available")
+		}
+		return
+	}
+
+	// Alert management endpoints
+	if strings.HasPrefix(path, "/api/v1/alerts") && alertHandler != nil {
+		switch {
+		case path == "/api/v1/alerts" && method == http.MethodGet:
+			alertHandler.ListAlerts(w, r)
+		case path == "/api/v1/alerts/statistics" && method == http.MethodGet:
+			alertHandler.GetAlertStatistics(w, r)
+		case matchesPattern(path, "/api/v1/alerts/*/silence") && method == http.MethodPost:
+			alertHandler.SilenceAlert(w, r)
+		case matchesPattern(path, "/api/v1/alerts/*/tickets") && method == http.MethodGet && ticketingHandler != nil:
+			ticketingHandler.ListAlertTickets(w, r)
+		case matchesPattern(path, "/api/v1/alerts/*/tickets") && method == http.MethodPost && ticketingHandler != nil:
+			ticketingHandler.OpenAlertTicket(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert operation not found")
+		}
+		return
+	}
+
+	// Maintenance window endpoints
+	if strings.HasPrefix(path, "/api/v1/maintenance-windows") && maintenanceHandler != nil {
+		switch {
+		case path == "/api/v1/maintenance-windows" && method == http.MethodGet:
+			maintenanceHandler.ListMaintenanceWindows(w, r)
+		case path == "/api/v1/maintenance-windows" && method == http.MethodPost:
+			maintenanceHandler.CreateMaintenanceWindow(w, r)
+		case matchesPattern(path, "/api/v1/maintenance-windows/*/expire") && method == http.MethodPost:
+			maintenanceHandler.ExpireMaintenanceWindow(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Maintenance window operation not found")
+		}
+		return
+	}
+
+	// Runbook endpoints
+	if strings.HasPrefix(path, "/api/v1/runbook") && runbookHandler != nil {
+		switch {
+		case path == "/api/v1/runbook-executions" && method == http.MethodGet:
+			runbookHandler.ListExecutions(w, r)
+		case matchesPattern(path, "/api/v1/runbooks/*") && method == http.MethodGet:
+			runbookHandler.GetRunbook(w, r)
+		case matchesPattern(path, "/api/v1/runbooks/*") && method == http.MethodPut:
+			runbookHandler.UpdateRunbook(w, r)
+		case matchesPattern(path, "/api/v1/runbooks/*") && method == http.MethodDelete:
+			runbookHandler.DeleteRunbook(w, r)
+		case matchesPattern(path, "/api/v1/runbooks/*/execute") && method == http.MethodPost:
+			runbookHandler.ExecuteRunbook(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Runbook operation not found")
+		}
+		return
+	}
+
+	// Long-running operation endpoints
+	if strings.HasPrefix(path, "/api/v1/operations") && operationHandler != nil {
+		switch {
+		case path == "/api/v1/operations" && method == http.MethodGet:
+			operationHandler.ListOperations(w, r)
+		case matchesPattern(path, "/api/v1/operations/*") && method == http.MethodGet:
+			operationHandler.GetOperation(w, r)
+		case matchesPattern(path, "/api/v1/operations/*/cancel") && method == http.MethodPost:
+			operationHandler.CancelOperation(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Operation endpoint not found")
+		}
+		return
+	}
+
+	// Background job queue endpoints
+	if strings.HasPrefix(path, "/api/v1/jobs") && jobQueueHandler != nil {
+		switch {
+		case path == "/api/v1/jobs" && method == http.MethodGet:
+			jobQueueHandler.ListJobs(w, r)
+		case path == "/api/v1/jobs/stats" && method == http.MethodGet:
+			jobQueueHandler.GetJobStats(w, r)
+		case path == "/api/v1/jobs/requeue" && method == http.MethodPost:
+			jobQueueHandler.RequeueDeadJobs(w, r)
+		case matchesPattern(path, "/api/v1/jobs/*") && method == http.MethodGet:
+			jobQueueHandler.GetJob(w, r)
+		case matchesPattern(path, "/api/v1/jobs/*") && method == http.MethodDelete:
+			jobQueueHandler.DeleteJob(w, r)
+		case matchesPattern(path, "/api/v1/jobs/*/requeue") && method == http.MethodPost:
+			jobQueueHandler.RequeueJob(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Job endpoint not found")
+		}
+		return
+	}
+
+	// Report template, schedule and archive endpoints
+	if strings.HasPrefix(path, "/api/v1/reports") && reportHandler != nil {
+		switch {
+		case path == "/api/v1/reports/templates" && method == http.MethodGet:
+			reportHandler.ListTemplates(w, r)
+		case path == "/api/v1/reports/schedules" && method == http.MethodGet:
+			reportHandler.ListSchedules(w, r)
+		case path == "/api/v1/reports/schedules" && method == http.MethodPost:
+			reportHandler.CreateSchedule(w, r)
+		case matchesPattern(path, "/api/v1/reports/schedules/*") && method == http.MethodGet:
+			reportHandler.GetSchedule(w, r)
+		case matchesPattern(path, "/api/v1/reports/schedules/*") && method == http.MethodPut:
+			reportHandler.UpdateSchedule(w, r)
+		case matchesPattern(path, "/api/v1/reports/schedules/*") && method == http.MethodDelete:
+			reportHandler.DeleteSchedule(w, r)
+		case matchesPattern(path, "/api/v1/reports/schedules/*/run") && method == http.MethodPost:
+			reportHandler.RunSchedule(w, r)
+		case path == "/api/v1/reports" && method == http.MethodGet:
+			reportHandler.ListReports(w, r)
+		case path == "/api/v1/reports" && method == http.MethodPost:
+			reportHandler.GenerateReport(w, r)
+		case matchesPattern(path, "/api/v1/reports/*") && method == http.MethodGet:
+			reportHandler.GetReport(w, r)
+		case matchesPattern(path, "/api/v1/reports/*") && method == http.MethodDelete:
+			reportHandler.DeleteReport(w, r)
+		case matchesPattern(path, "/api/v1/reports/*/download") && method == http.MethodGet:
+			reportHandler.DownloadReport(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Report endpoint not found")
+		}
+		return
+	}
+
+	// Data export endpoints; downloads are public and authorized by their signature
+	if strings.HasPrefix(path, "/api/v1/data-exports") && dataExportHandler != nil {
+		switch {
+		case matchesPattern(path, "/api/v1/data-exports/download/*") && method == http.MethodGet:
+			dataExportHandler.Download(w, r)
+		case path == "/api/v1/data-exports" && method == http.MethodGet:
+			dataExportHandler.ListExports(w, r)
+		case path == "/api/v1/data-exports" && method == http.MethodPost:
+			dataExportHandler.CreateExport(w, r)
+		case matchesPattern(path, "/api/v1/data-exports/*") && method == http.MethodGet:
+			dataExportHandler.GetExport(w, r)
+		case matchesPattern(path, "/api/v1/data-exports/*") && method == http.MethodDelete:
+			dataExportHandler.DeleteExport(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Data export endpoint not found")
+		}
+		return
+	}
+
+	// Annotation endpoints; inbound webhook posts are public and authorized by the webhook's token
+	if strings.HasPrefix(path, "/api/v1/annotations") && annotationHandler != nil {
+		switch {
+		case matchesPattern(path, "/api/v1/annotations/inbound/*") && method == http.MethodPost:
+			annotationHandler.Inbound(w, r)
+		case path == "/api/v1/annotations/webhooks" && method == http.MethodGet:
+			annotationHandler.ListWebhooks(w, r)
+		case path == "/api/v1/annotations/webhooks" && method == http.MethodPost:
+			annotationHandler.CreateWebhook(w, r)
+		case matchesPattern(path, "/api/v1/annotations/webhooks/*/token") && method == http.MethodPost:
+			annotationHandler.RotateWebhookToken(w, r)
+		case matchesPattern(path, "/api/v1/annotations/webhooks/*") && method == http.MethodDelete:
+			annotationHandler.DeleteWebhook(w, r)
+		case path == "/api/v1/annotations" && method == http.MethodGet:
+			annotationHandler.ListAnnotations(w, r)
+		case path == "/api/v1/annotations" && method == http.MethodPost:
+			annotationHandler.CreateAnnotation(w, r)
+		case matchesPattern(path, "/api/v1/annotations/*") && method == http.MethodGet:
+			annotationHandler.GetAnnotation(w, r)
+		case matchesPattern(path, "/api/v1/annotations/*") && (method == http.MethodPut || method == http.MethodPatch):
+			annotationHandler.UpdateAnnotation(w, r)
+		case matchesPattern(path, "/api/v1/annotations/*") && method == http.MethodDelete:
+			annotationHandler.DeleteAnnotation(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Annotation endpoint not found")
+		}
+		return
+	}
+
+	// SLO, error budget and burn-rate alert endpoints
+	if strings.HasPrefix(path, "/api/v1/slos") && sloHandler != nil {
+		switch {
+		case path == "/api/v1/slos" && method == http.MethodGet:
+			sloHandler.ListSLOs(w, r)
+		case path == "/api/v1/slos" && method == http.MethodPost:
+			sloHandler.CreateSLO(w, r)
+		case matchesPattern(path, "/api/v1/slos/*") && method == http.MethodGet:
+			sloHandler.GetSLO(w, r)
+		case matchesPattern(path, "/api/v1/slos/*") && method == http.MethodPut:
+			sloHandler.UpdateSLO(w, r)
+		case matchesPattern(path, "/api/v1/slos/*") && method == http.MethodDelete:
+			sloHandler.DeleteSLO(w, r)
+		case matchesPattern(path, "/api/v1/slos/*/evaluate") && method == http.MethodPost:
+			sloHandler.EvaluateSLO(w, r)
+		case matchesPattern(path, "/api/v1/slos/*/history") && method == http.MethodGet:
+			sloHandler.GetSLOHistory(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "SLO endpoint not found")
+		}
+		return
+	}
+
+	// Synthetic check, result and uptime endpoints
+	if strings.HasPrefix(path, "/api/v1/synthetics") && syntheticHandler != nil {
+		switch {
+		case path == "/api/v1/synthetics" && method == http.MethodGet:
+			syntheticHandler.ListChecks(w, r)
+		case path == "/api/v1/synthetics" && method == http.MethodPost:
+			syntheticHandler.CreateCheck(w, r)
+		case matchesPattern(path, "/api/v1/synthetics/*") && method == http.MethodGet:
+			syntheticHandler.GetCheck(w, r)
+		case matchesPattern(path, "/api/v1/synthetics/*") && method == http.MethodPut:
+			syntheticHandler.UpdateCheck(w, r)
+		case matchesPattern(path, "/api/v1/synthetics/*") && method == http.MethodDelete:
+			syntheticHandler.DeleteCheck(w, r)
+		case matchesPattern(path, "/api/v1/synthetics/*/run") && method == http.MethodPost:
+			syntheticHandler.RunCheck(w, r)
+		case matchesPattern(path, "/api/v1/synthetics/*/results") && method == http.MethodGet:
+			syntheticHandler.ListResults(w, r)
+		case matchesPattern(path, "/api/v1/synthetics/*/uptime") && method == http.MethodGet:
+			syntheticHandler.GetUptime(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Synthetic check endpoint not found")
+		}
+		return
+	}
+
+	// Certificate inventory and expiry endpoints
+	if strings.HasPrefix(path, "/api/v1/certificates") && certificateHandler != nil {
+		switch {
+		case path == "/api/v1/certificates" && method == http.MethodGet:
+			certificateHandler.ListCertificates(w, r)
+		case path == "/api/v1/certificates" && method == http.MethodPost:
+			certificateHandler.CreateCertificate(w, r)
+		case path == "/api/v1/certificates/scan" && method == http.MethodPost:
+			certificateHandler.ScanCertificates(w, r)
+		case matchesPattern(path, "/api/v1/certificates/*") && method == http.MethodGet:
+			certificateHandler.GetCertificate(w, r)
+		case matchesPattern(path, "/api/v1/certificates/*") && method == http.MethodPut:
+			certificateHandler.UpdateCertificate(w, r)
+		case matchesPattern(path, "/api/v1/certificates/*") && method == http.MethodDelete:
+			certificateHandler.DeleteCertificate(w, r)
+		case matchesPattern(path, "/api/v1/certificates/*/check") && method == http.MethodPost:
+			certificateHandler.CheckCertificate(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Certificate endpoint not found")
+		}
+		return
+	}
+
+	// Network diagnostic endpoints
+	if strings.HasPrefix(path, "/api/v1/diagnostics") && networkDiagnosticHandler != nil {
+		switch {
+		case path == "/api/v1/diagnostics" && method == http.MethodGet:
+			networkDiagnosticHandler.ListDiagnostics(w, r)
+		case path == "/api/v1/diagnostics" && method == http.MethodPost:
+			networkDiagnosticHandler.RunDiagnostic(w, r)
+		case matchesPattern(path, "/api/v1/diagnostics/*") && method == http.MethodGet:
+			networkDiagnosticHandler.GetDiagnostic(w, r)
+		case matchesPattern(path, "/api/v1/diagnostics/*") && method == http.MethodDelete:
+			networkDiagnosticHandler.DeleteDiagnostic(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Diagnostic endpoint not found")
+		}
+		return
+	}
+
+	// Detailed component health for administrators
+	if path == "/api/v1/health/details" && method == http.MethodGet {
+		if healthCheckHandler != nil {
+			healthCheckHandler.Details(w, r)
+		} else {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Health service not available")
+		}
+		return
+	}
+
+	// Route latency against the SLOs for administrators
+	if path == "/api/v1/health/latency" && method == http.MethodGet {
+		if healthCheckHandler != nil {
+			healthCheckHandler.Latency(w, r)
+		} else {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Health service not available")
+		}
+		return
+	}
+
+	// Diagnostics bundle for support
+	if path == "/api/v1/admin/diagnostics" {
+		if diagnosticsHandler == nil {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Diagnostics not available")
+		} else if method != http.MethodPost {
+			respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		} else {
+			diagnosticsHandler.CreateBundle(w, r)
+		}
+		return
+	}
+
+	// Topology map of clusters and managed hosts
+	if path == "/api/v1/topology" && method == http.MethodGet {
+		if topologyHandler != nil {
+			topologyHandler.GetTopology(w, r)
+		} else {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Topology service not available")
+		}
+		return
+	}
+
+	// Global search across the inventory
+	if path == "/api/v1/search" && method == http.MethodGet {
+		if searchHandler != nil {
+			searchHandler.Search(w, r)
+		} else {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Search service not available")
+		}
+		return
+	}
+
+	// Tags on clusters, data sources, dashboards, alert rules and Helm releases
+	if strings.HasPrefix(path, "/api/v1/tags") && tagHandler != nil {
+		switch {
+		case path == "/api/v1/tags" && method == http.MethodGet:
+			tagHandler.GetTags(w, r)
+		case path == "/api/v1/tags/keys" && method == http.MethodGet:
+			tagHandler.ListTagKeys(w, r)
+		case path == "/api/v1/tags/bulk" && method == http.MethodPost:
+			tagHandler.BulkTags(w, r)
+		case matchesPattern(path, "/api/v1/tags/*/*") && method == http.MethodPut:
+			tagHandler.SetTags(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Tag endpoint not found")
+		}
+		return
+	}
+
+	// Websocket endpoint for the platform event stream
+	if path == "/api/v1/events/ws" && method == http.MethodGet {
+		if eventStreamHandler != nil {
+			eventStreamHandler.ServeHTTP(w, r)
+		} else {
+			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "WebSocket service not available")
+		}
+		return
+	}
+
+	// Webhook endpoints
+	if strings.HasPrefix(path, "/api/v1/webhooks") && webhookHandler != nil {
+		switch {
+		case path == "/api/v1/webhooks/events" && method == http.MethodGet:
+			webhookHandler.ListEventTypes(w, r)
+		case path == "/api/v1/webhooks/endpoints" && method == http.MethodGet:
+			webhookHandler.ListEndpoints(w, r)
+		case path == "/api/v1/webhooks/endpoints" && method == http.MethodPost:
+			webhookHandler.CreateEndpoint(w, r)
+		case matchesPattern(path, "/api/v1/webhooks/endpoints/*") && method == http.MethodGet:
+			webhookHandler.GetEndpoint(w, r)
+		case matchesPattern(path, "/api/v1/webhooks/endpoints/*") && method == http.MethodPut:
+			webhookHandler.UpdateEndpoint(w, r)
+		case matchesPattern(path, "/api/v1/webhooks/endpoints/*") && method == http.MethodDelete:
+			webhookHandler.DeleteEndpoint(w, r)
+		case matchesPattern(path, "/api/v1/webhooks/endpoints/*/ping") && method == http.MethodPost:
+			webhookHandler.PingEndpoint(w, r)
+		case matchesPattern(path, "/api/v1/webhooks/endpoints/*/deliveries") && method == http.MethodGet:
+			webhookHandler.ListDeliveries(w, r)
+		case matchesPattern(path, "/api/v1/webhooks/deliveries/*/redrive") && method == http.MethodPost:
+			webhookHandler.RedriveDelivery(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Webhook operation not found")
+		}
+		return
+	}
+
+	// Jira and ServiceNow integrations, and the webhooks they call back
+	if strings.HasPrefix(path, "/api/v1/ticketing") && ticketingHandler != nil {
+		switch {
+		case path == "/api/v1/ticketing/integrations" && method == http.MethodGet:
+			ticketingHandler.ListIntegrations(w, r)
+		case path == "/api/v1/ticketing/integrations" && method == http.MethodPost:
+			ticketingHandler.CreateIntegration(w, r)
+		case matchesPattern(path, "/api/v1/ticketing/integrations/*") && method == http.MethodGet:
+			ticketingHandler.GetIntegration(w, r)
+		case matchesPattern(path, "/api/v1/ticketing/integrations/*") && method == http.MethodPut:
+			ticketingHandler.UpdateIntegration(w, r)
+		case matchesPattern(path, "/api/v1/ticketing/integrations/*") && method == http.MethodDelete:
+			ticketingHandler.DeleteIntegration(w, r)
+		case matchesPattern(path, "/api/v1/ticketing/integrations/*/test") && method == http.MethodPost:
+			ticketingHandler.TestIntegration(w, r)
+		case matchesPattern(path, "/api/v1/ticketing/integrations/*/inbound-token") && method == http.MethodPost:
+			ticketingHandler.RotateInboundToken(w, r)
+		case matchesPattern(path, "/api/v1/ticketing/inbound/*") && method == http.MethodPost:
+			ticketingHandler.Inbound(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Ticketing operation not found")
+		}
+		return
+	}
+
+	// Slack and Teams integrations, the chat accounts linked to users, and the
+	// commands chat systems send
+	if strings.HasPrefix(path, "/api/v1/chatops") && chatOpsHandler != nil {
+		switch {
+		case path == "/api/v1/chatops/integrations" && method == http.MethodGet:
+			chatOpsHandler.ListIntegrations(w, r)
+		case path == "/api/v1/chatops/integrations" && method == http.MethodPost:
+			chatOpsHandler.CreateIntegration(w, r)
+		case matchesPattern(path, "/api/v1/chatops/integrations/*") && method == http.MethodGet:
+			chatOpsHandler.GetIntegration(w, r)
+		case matchesPattern(path, "/api/v1/chatops/integrations/*") && method == http.MethodPut:
+			chatOpsHandler.UpdateIntegration(w, r)
+		case matchesPattern(path, "/api/v1/chatops/integrations/*") && method == http.MethodDelete:
+			chatOpsHandler.DeleteIntegration(w, r)
+		case matchesPattern(path, "/api/v1/chatops/integrations/*/links") && method == http.MethodGet:
+			chatOpsHandler.ListIntegrationLinks(w, r)
+		case path == "/api/v1/chatops/links" && method == http.MethodGet:
+			chatOpsHandler.ListLinks(w, r)
+		case path == "/api/v1/chatops/links" && method == http.MethodPost:
+			chatOpsHandler.ConfirmLink(w, r)
+		case matchesPattern(path, "/api/v1/chatops/links/*") && method == http.MethodDelete:
+			chatOpsHandler.DeleteLink(w, r)
+		case matchesPattern(path, "/api/v1/chatops/inbound/*") && method == http.MethodPost:
+			chatOpsHandler.Inbound(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "ChatOps operation not found")
+		}
+		return
+	}
+
+	// Replies to alert emails, posted by the mail provider's inbound webhook
+	if path == "/api/v1/email/inbound" && method == http.MethodPost && alertEmailHandler != nil {
+		alertEmailHandler.Inbound(w, r)
+		return
+	}
+
+	// Container image and registry endpoints
+	if strings.HasPrefix(path, "/api/v1/images") && imageHandler != nil {
+		switch {
+		case path == "/api/v1/images" && method == http.MethodGet:
+			imageHandler.ListImages(w, r)
+		case path == "/api/v1/images/findings" && method == http.MethodGet:
+			imageHandler.ListFindings(w, r)
+		case path == "/api/v1/images/inspect" && method == http.MethodGet:
+			imageHandler.InspectImage(w, r)
+		case path == "/api/v1/images/tags" && method == http.MethodGet:
+			imageHandler.ListTags(w, r)
+		case path == "/api/v1/images/registries" && method == http.MethodGet:
+			imageHandler.ListRegistries(w, r)
+		case path == "/api/v1/images/registries" && method == http.MethodPost:
+			imageHandler.CreateRegistry(w, r)
+		case matchesPattern(path, "/api/v1/images/registries/*") && method == http.MethodGet:
+			imageHandler.GetRegistry(w, r)
+		case matchesPattern(path, "/api/v1/images/registries/*") && method == http.MethodPut:
+			imageHandler.UpdateRegistry(w, r)
+		case matchesPattern(path, "/api/v1/images/registries/*") && method == http.MethodDelete:
+			imageHandler.DeleteRegistry(w, r)
+		case matchesPattern(path, "/api/v1/images/registries/*/test") && method == http.MethodPost:
+			imageHandler.TestRegistry(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Image operation not found")
+		}
+		return
+	}
+
+	// Compliance scan, report and schedule endpoints
+	if strings.HasPrefix(path, "/api/v1/compliance") && complianceHandler != nil {
+		switch {
+		case path == "/api/v1/compliance/checks" && method == http.MethodGet:
+			complianceHandler.ListChecks(w, r)
+		case path == "/api/v1/compliance/scans" && method == http.MethodPost:
+			complianceHandler.RunScan(w, r)
+		case path == "/api/v1/compliance/trend" && method == http.MethodGet:
+			complianceHandler.GetTrend(w, r)
+		case path == "/api/v1/compliance/reports" && method == http.MethodGet:
+			complianceHandler.ListReports(w, r)
+		case matchesPattern(path, "/api/v1/compliance/reports/*") && method == http.MethodGet:
+			complianceHandler.GetReport(w, r)
+		case matchesPattern(path, "/api/v1/compliance/reports/*/export") && method == http.MethodGet:
+			complianceHandler.ExportReport(w, r)
+		case path == "/api/v1/compliance/schedules" && method == http.MethodGet:
+			complianceHandler.ListSchedules(w, r)
+		case path == "/api/v1/compliance/schedules" && method == http.MethodPost:
+			complianceHandler.CreateSchedule(w, r)
+		case matchesPattern(path, "/api/v1/compliance/schedules/*") && method == http.MethodGet:
+			complianceHandler.GetSchedule(w, r)
+		case matchesPattern(path, "/api/v1/compliance/schedules/*") && method == http.MethodPut:
+			complianceHandler.UpdateSchedule(w, r)
+		case matchesPattern(path, "/api/v1/compliance/schedules/*") && method == http.MethodDelete:
+			complianceHandler.DeleteSchedule(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Compliance operation not found")
+		}
+		return
+	}
+
+	// Platform backup endpoints
+	if strings.HasPrefix(path, "/api/v1/backups") && backupHandler != nil {
+		switch {
+		case path == "/api/v1/backups/status" && method == http.MethodGet:
+			backupHandler.GetStatus(w, r)
+		case path == "/api/v1/backups/targets" && method == http.MethodGet:
+			backupHandler.ListTargets(w, r)
+		case path == "/api/v1/backups/targets" && method == http.MethodPost:
+			backupHandler.CreateTarget(w, r)
+		case matchesPattern(path, "/api/v1/backups/targets/*") && method == http.MethodGet:
+			backupHandler.GetTarget(w, r)
+		case matchesPattern(path, "/api/v1/backups/targets/*") && method == http.MethodPut:
+			backupHandler.UpdateTarget(w, r)
+		case matchesPattern(path, "/api/v1/backups/targets/*") && method == http.MethodDelete:
+			backupHandler.DeleteTarget(w, r)
+		case matchesPattern(path, "/api/v1/backups/targets/*/test") && method == http.MethodPost:
+			backupHandler.TestTarget(w, r)
+		case path == "/api/v1/backups" && method == http.MethodGet:
+			backupHandler.ListBackups(w, r)
+		case path == "/api/v1/backups" && method == http.MethodPost:
+			backupHandler.StartBackup(w, r)
+		case matchesPattern(path, "/api/v1/backups/*") && method == http.MethodGet:
+			backupHandler.GetBackup(w, r)
+		case matchesPattern(path, "/api/v1/backups/*") && method == http.MethodDelete:
+			backupHandler.DeleteBackup(w, r)
+		case matchesPattern(path, "/api/v1/backups/*/download") && method == http.MethodGet:
+			backupHandler.DownloadBackup(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Backup operation not found")
 		}
 		return
 	}
 
-	// Host-specific file transfer endpoints
-	if matchesPattern(path, "/api/v1/hosts/*/transfers") && method == http.MethodGet {
-		if fileHandler != nil {
-			fileHandler.GetTransfers(w, r)
-		} else {
-			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "File service not available")
+	// Remote write target endpoints
+	if strings.HasPrefix(path, "/api/v1/metrics/remote-write") && remoteWriteHandler != nil {
+		switch {
+		case path == "/api/v1/metrics/remote-write" && method == http.MethodGet:
+			remoteWriteHandler.ListTargets(w, r)
+		case path == "/api/v1/metrics/remote-write" && method == http.MethodPost:
+			remoteWriteHandler.CreateTarget(w, r)
+		case matchesPattern(path, "/api/v1/metrics/remote-write/*") && method == http.MethodGet:
+			remoteWriteHandler.GetTarget(w, r)
+		case matchesPattern(path, "/api/v1/metrics/remote-write/*") && method == http.MethodPut:
+			remoteWriteHandler.UpdateTarget(w, r)
+		case matchesPattern(path, "/api/v1/metrics/remote-write/*") && method == http.MethodDelete:
+			remoteWriteHandler.DeleteTarget(w, r)
+		case matchesPattern(path, "/api/v1/metrics/remote-write/*/test") && method == http.MethodPost:
+			remoteWriteHandler.TestTarget(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Remote write operation not found")
 		}
 		return
 	}
 
-	// Process management endpoints
-	if strings.HasPrefix(path, "/api/v1/processes/") && processHandler != nil {
+	// Runtime settings endpoints
+	if strings.HasPrefix(path, "/api/v1/settings") && settingsHandler != nil {
 		switch {
-		case path == "/api/v1/processes/list" && method == http.MethodPost:
-			processHandler.ListProcesses(w, r)
-		case path == "/api/v1/processes/get" && method == http.MethodPost:
-			processHandler.GetProcess(w, r)
-		case path == "/api/v1/processes/kill" && method == http.MethodPost:
-			processHandler.KillProcess(w, r)
-		case path == "/api/v1/processes/execute" && method == http.MethodPost:
-			processHandler.ExecuteCommand(w, r)
-		case path == "/api/v1/processes/executions" && method == http.MethodGet:
-			processHandler.GetExecutions(w, r)
+		case path == "/api/v1/settings" && method == http.MethodGet:
+			settingsHandler.ListSettings(w, r)
+		case matchesPattern(path, "/api/v1/settings/*") && method == http.MethodGet:
+			settingsHandler.GetSetting(w, r)
+		case matchesPattern(path, "/api/v1/settings/*") && method == http.MethodPut:
+			settingsHandler.UpdateSetting(w, r)
+		case matchesPattern(path, "/api/v1/settings/*") && method == http.MethodDelete:
+			settingsHandler.ResetSetting(w, r)
 		default:
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Process operation not found")
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Settings operation not found")
 		}
 		return
 	}
 
-	// Host-specific process execution endpoints
-	if matchesPattern(path, "/api/v1/hosts/*/executions") && method == http.MethodGet {
-		if processHandler != nil {
-			processHandler.GetExecutions(w, r)
-		} else {
-			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Process service not available")
+	// Feature flag endpoints
+	if strings.HasPrefix(path, "/api/v1/feature-flags") && featureFlagHandler != nil {
+		switch {
+		case path == "/api/v1/feature-flags" && method == http.MethodGet:
+			featureFlagHandler.ListFlags(w, r)
+		case matchesPattern(path, "/api/v1/feature-flags/*") && method == http.MethodGet:
+			featureFlagHandler.GetFlag(w, r)
+		case matchesPattern(path, "/api/v1/feature-flags/*") && method == http.MethodPut:
+			featureFlagHandler.UpdateFlag(w, r)
+		case matchesPattern(path, "/api/v1/feature-flags/*") && method == http.MethodDelete:
+			featureFlagHandler.DeleteFlag(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Feature flag operation not found")
 		}
 		return
 	}
 
-	// Batch task endpoints
-	if strings.HasPrefix(path, "/api/v1/batch-tasks") && batchTaskHandler != nil {
+	// Agent plugin endpoints
+	if strings.HasPrefix(path, "/api/v1/agent-plugins") && agentPluginHandler != nil {
 		switch {
-		case path == "/api/v1/batch-tasks" && method == http.MethodPost:
-			batchTaskHandler.CreateBatchTask(w, r)
-		case path == "/api/v1/batch-tasks" && method == http.MethodGet:
-			batchTaskHandler.ListBatchTasks(w, r)
-		case path == "/api/v1/batch-tasks/execute" && method == http.MethodPost:
-			batchTaskHandler.ExecuteBatchTask(w, r)
-		case path == "/api/v1/batch-tasks/cancel" && method == http.MethodPost:
-			batchTaskHandler.CancelBatchTask(w, r)
-		case matchesPattern(path, "/api/v1/batch-tasks/*"):
-			if method == http.MethodGet {
-				batchTaskHandler.GetBatchTask(w, r)
-			} else if method == http.MethodDelete {
-				batchTaskHandler.DeleteBatchTask(w, r)
-			} else {
-				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Batch task operation not found")
-			}
+		case path == "/api/v1/agent-plugins" && method == http.MethodGet:
+			agentPluginHandler.ListPlugins(w, r)
+		case path == "/api/v1/agent-plugins" && method == http.MethodPost:
+			agentPluginHandler.CreatePlugin(w, r)
+		case matchesPattern(path, "/api/v1/agent-plugins/*") && method == http.MethodGet:
+			agentPluginHandler.GetPlugin(w, r)
+		case matchesPattern(path, "/api/v1/agent-plugins/*") && method == http.MethodPut:
+			agentPluginHandler.UpdatePlugin(w, r)
+		case matchesPattern(path, "/api/v1/agent-plugins/*") && method == http.MethodDelete:
+			agentPluginHandler.DeletePlugin(w, r)
 		default:
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Batch task operation not found")
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Agent plugin operation not found")
 		}
 		return
 	}
 
-	// Cluster management endpoints
-	if strings.HasPrefix(path, "/api/v1/clusters") && clusterHandler != nil {
-		// Check for metrics endpoints first
-		if clusterMetricsHandler != nil {
-			switch {
-			case matchesPattern(path, "/api/v1/clusters/*/metrics") && method == http.MethodGet:
-				clusterMetricsHandler.GetClusterMetrics(w, r)
-				return
-			case matchesPattern(path, "/api/v1/clusters/*/metrics/summary") && method == http.MethodGet:
-				clusterMetricsHandler.GetClusterMetricsSummary(w, r)
-				return
-			case matchesPattern(path, "/api/v1/clusters/*/metrics/live") && method == http.MethodGet:
-				clusterMetricsHandler.GetLiveClusterMetrics(w, r)
-				return
-			case matchesPattern(path, "/api/v1/clusters/*/refresh") && method == http.MethodPost:
-				clusterMetricsHandler.RefreshMetrics(w, r)
-				return
-			case matchesPattern(path, "/api/v1/clusters/*/namespaces") && method == http.MethodGet:
-				clusterMetricsHandler.ListNamespaces(w, r)
-				return
-			case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/metrics") && method == http.MethodGet:
-				clusterMetricsHandler.GetPodMetrics(w, r)
-				return
-			case matchesPattern(path, "/api/v1/nodes/*/metrics") && method == http.MethodGet:
-				clusterMetricsHandler.GetNodeMetrics(w, r)
-				return
-			case matchesPattern(path, "/api/v1/nodes/*/live-metrics") && method == http.MethodGet:
-				clusterMetricsHandler.GetLiveNodeMetrics(w, r)
-				return
-			}
-		}
-
+	// Directory sync endpoints
+	if strings.HasPrefix(path, "/api/v1/directory-sync") && directorySyncHandler != nil {
 		switch {
-		case path == "/api/v1/clusters" && method == http.MethodPost:
-			clusterHandler.CreateCluster(w, r)
-		case path == "/api/v1/clusters" && method == http.MethodGet:
-			clusterHandler.ListClusters(w, r)
-		case path == "/api/v1/clusters/test-connection" && method == http.MethodPost:
-			clusterHandler.TestConnection(w, r)
-		case matchesPattern(path, "/api/v1/clusters/*/nodes") && method == http.MethodGet:
-			clusterHandler.GetClusterNodes(w, r)
-		case matchesPattern(path, "/api/v1/clusters/*/info") && method == http.MethodGet:
-			clusterHandler.GetClusterInfo(w, r)
-		case matchesPattern(path, "/api/v1/clusters/*"):
-			if method == http.MethodGet {
-				clusterHandler.GetCluster(w, r)
-			} else if method == http.MethodPut {
-				clusterHandler.UpdateCluster(w, r)
-			} else if method == http.MethodDelete {
-				clusterHandler.DeleteCluster(w, r)
-			} else {
-				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster operation not found")
-			}
+		case path == "/api/v1/directory-sync" && method == http.MethodGet:
+			directorySyncHandler.GetStatus(w, r)
+		case path == "/api/v1/directory-sync/preview" && method == http.MethodPost:
+			directorySyncHandler.Preview(w, r)
+		case path == "/api/v1/directory-sync/apply" && method == http.MethodPost:
+			directorySyncHandler.Apply(w, r)
 		default:
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster operation not found")
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Directory sync operation not found")
 		}
 		return
 	}
 
-	// Workload management endpoints
-	if strings.HasPrefix(path, "/api/v1/clusters") && workloadHandler != nil {
-		// Websocket endpoint for pod logs streaming
-		if path == "/api/v1/clusters/pod-logs/ws" && method == http.MethodGet {
-			if podLogsWSHandler != nil {
-				podLogsWSHandler.ServeHTTP(w, r)
-			} else {
-				respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "WebSocket service not available")
-			}
-			return
+	// Namespace binding endpoints
+	if strings.HasPrefix(path, "/api/v1/namespace-bindings") && namespaceBindingHandler != nil {
+		switch {
+		case path == "/api/v1/namespace-bindings" && method == http.MethodGet:
+			namespaceBindingHandler.ListBindings(w, r)
+		case path == "/api/v1/namespace-bindings" && method == http.MethodPost:
+			namespaceBindingHandler.CreateBinding(w, r)
+		case matchesPattern(path, "/api/v1/namespace-bindings/*") && method == http.MethodDelete:
+			namespaceBindingHandler.DeleteBinding(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Namespace binding operation not found")
 		}
+		return
+	}
 
-		// Websocket endpoint for pod terminal
-		if path == "/api/v1/clusters/pod-terminal/ws" && method == http.MethodGet {
-			if podTerminalWSHandler != nil {
-				podTerminalWSHandler.ServeHTTP(w, r)
-			} else {
-				respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "WebSocket service not available")
-			}
-			return
+	// Invitation endpoints
+	if strings.HasPrefix(path, "/api/v1/invitations") && accountHandler != nil {
+		switch {
+		case path == "/api/v1/invitations" && method == http.MethodGet:
+			accountHandler.ListInvitations(w, r)
+		case path == "/api/v1/invitations" && method == http.MethodPost:
+			accountHandler.CreateInvitation(w, r)
+		case matchesPattern(path, "/api/v1/invitations/*") && method == http.MethodDelete:
+			accountHandler.DeleteInvitation(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Invitation operation not found")
 		}
+		return
+	}
 
+	// Usage and quota endpoints
+	if (strings.HasPrefix(path, "/api/v1/usage") || strings.HasPrefix(path, "/api/v1/quotas")) && quotaHandler != nil {
 		switch {
-		case matchesPattern(path, "/api/v1/clusters/*/namespaces") && method == http.MethodGet:
-			workloadHandler.ListNamespaces(w, r)
-			return
-		case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/deployments") && method == http.MethodGet:
-			workloadHandler.ListDeployments(w, r)
-			return
-		case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/pods") && method == http.MethodGet:
-			workloadHandler.ListPods(w, r)
-			return
-		case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/pods/*/detail") && method == http.MethodGet:
-			workloadHandler.GetPodDetail(w, r)
-			return
-		case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/pods/*/logs") && method == http.MethodGet:
-			workloadHandler.GetPodLogs(w, r)
-			return
-		case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/pods/*") && method == http.MethodDelete:
-			workloadHandler.DeletePod(w, r)
-			return
-		case matchesPattern(path, "/api/v1/clusters/*/namespaces/*/services") && method == http.MethodGet:
-			workloadHandler.ListServices(w, r)
-			return
+		case path == "/api/v1/usage" && method == http.MethodGet:
+			quotaHandler.GetUsageSummary(w, r)
+		case path == "/api/v1/usage/me" && method == http.MethodGet:
+			quotaHandler.GetMyUsage(w, r)
+		case path == "/api/v1/quotas" && method == http.MethodGet:
+			quotaHandler.ListQuotas(w, r)
+		case path == "/api/v1/quotas" && method == http.MethodPut:
+			quotaHandler.SetQuota(w, r)
+		case matchesPattern(path, "/api/v1/quotas/*") && method == http.MethodDelete:
+			quotaHandler.DeleteQuota(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Quota operation not found")
 		}
+		return
 	}
 
-	if strings.HasPrefix(path, "/api/v1/hosts") {
-		// Host management endpoints
-		if hostHandler != nil {
-			hostHandler.ServeHTTP(w, r)
-		} else {
-			respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Host service not available")
+	// Own account MFA endpoints
+	if strings.HasPrefix(path, "/api/v1/account/mfa") && accountHandler != nil {
+		switch {
+		case path == "/api/v1/account/mfa" && method == http.MethodGet:
+			accountHandler.GetMFAStatus(w, r)
+		case path == "/api/v1/account/mfa/enroll" && method == http.MethodPost:
+			accountHandler.EnrollMFA(w, r)
+		case path == "/api/v1/account/mfa/activate" && method == http.MethodPost:
+			accountHandler.ActivateMFA(w, r)
+		case path == "/api/v1/account/mfa/disable" && method == http.MethodPost:
+			accountHandler.DisableMFA(w, r)
+		case path == "/api/v1/account/mfa/recovery-codes" && method == http.MethodPost:
+			accountHandler.RegenerateRecoveryCodes(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "MFA operation not found")
 		}
 		return
 	}
 
-	// Alert management endpoints
-	if strings.HasPrefix(path, "/api/v1/alerts") && alertHandler != nil {
+	// Alert group analysis endpoints
+	if strings.HasPrefix(path, "/api/v1/alert-groups") && alertGroupHandler != nil {
 		switch {
-		case path == "/api/v1/alerts" && method == http.MethodGet:
-			alertHandler.ListAlerts(w, r)
-		case path == "/api/v1/alerts/statistics" && method == http.MethodGet:
-			alertHandler.GetAlertStatistics(w, r)
-		case matchesPattern(path, "/api/v1/alerts/*/silence") && method == http.MethodPost:
-			alertHandler.SilenceAlert(w, r)
+		case matchesPattern(path, "/api/v1/alert-groups/*/analysis") && method == http.MethodGet:
+			alertGroupHandler.GetAnalysis(w, r)
+		case matchesPattern(path, "/api/v1/alert-groups/*/analysis/regenerate") && method == http.MethodPost:
+			alertGroupHandler.RegenerateAnalysis(w, r)
 		default:
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert operation not found")
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert group operation not found")
 		}
 		return
 	}
@@ -394,6 +1768,10 @@ func API(w http.ResponseWriter, r *http.Request) {
 			alertHandler.CreateAlertRule(w, r)
 		case path == "/api/v1/alert-rules" && method == http.MethodGet:
 			alertHandler.ListAlertRules(w, r)
+		case matchesPattern(path, "/api/v1/alert-rules/*/runbooks") && method == http.MethodGet && runbookHandler != nil:
+			runbookHandler.ListRunbooks(w, r)
+		case matchesPattern(path, "/api/v1/alert-rules/*/runbooks") && method == http.MethodPost && runbookHandler != nil:
+			runbookHandler.CreateRunbook(w, r)
 		case matchesPattern(path, "/api/v1/alert-rules/*"):
 			if method == http.MethodGet {
 				alertHandler.GetAlertRule(w, r)
@@ -432,6 +1810,10 @@ func API(w http.ResponseWriter, r *http.Request) {
 			auditHandler.GetUserActivity(w, r)
 		case path == "/api/v1/audit-logs/resource-activity" && method == http.MethodGet:
 			auditHandler.GetResourceActivity(w, r)
+		case path == "/api/v1/audit-logs/verify" && method == http.MethodGet:
+			auditHandler.VerifyAuditChain(w, r)
+		case path == "/api/v1/audit-logs/checkpoints" && method == http.MethodGet:
+			auditHandler.ListAuditCheckpoints(w, r)
 		default:
 			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Audit log operation not found")
 		}
@@ -468,6 +1850,10 @@ func API(w http.ResponseWriter, r *http.Request) {
 			notificationHandler.GetNotifications(w, r)
 		case path == "/api/v1/notifications" && method == http.MethodPost:
 			notificationHandler.CreateNotification(w, r)
+		case path == "/api/v1/notifications/search" && method == http.MethodGet:
+			notificationHandler.SearchNotifications(w, r)
+		case path == "/api/v1/notifications/bulk" && method == http.MethodPost:
+			notificationHandler.BulkUpdateNotifications(w, r)
 		case path == "/api/v1/notifications/unread-count" && method == http.MethodGet:
 			notificationHandler.GetUnreadCount(w, r)
 		case path == "/api/v1/notifications/mark-all-read" && method == http.MethodPost:
@@ -478,6 +1864,8 @@ func API(w http.ResponseWriter, r *http.Request) {
 			notificationHandler.GetNotificationPreference(w, r)
 		case path == "/api/v1/notifications/preferences" && method == http.MethodPut:
 			notificationHandler.UpdateNotificationPreference(w, r)
+		case path == "/api/v1/notifications/preferences/preview" && method == http.MethodPost:
+			notificationHandler.PreviewNotificationPreference(w, r)
 		case matchesPattern(path, "/api/v1/notifications/*/read"):
 			if method == http.MethodPost || method == http.MethodPut {
 				notificationHandler.MarkAsRead(w, r)
@@ -505,6 +1893,10 @@ func API(w http.ResponseWriter, r *http.Request) {
 			userManagementHandler.CreateUser(w, r)
 		case path == "/api/v1/users/check-permission" && method == http.MethodGet:
 			userManagementHandler.CheckPermission(w, r)
+		case matchesPattern(path, "/api/v1/users/*/unlock") && method == http.MethodPost && accountHandler != nil:
+			accountHandler.UnlockUser(w, r)
+		case matchesPattern(path, "/api/v1/users/*/mfa") && method == http.MethodDelete && accountHandler != nil:
+			accountHandler.ResetUserMFA(w, r)
 		case matchesPattern(path, "/api/v1/users/*/roles"):
 			if method == http.MethodGet {
 				userManagementHandler.GetUserRoles(w, r)
@@ -587,6 +1979,10 @@ func API(w http.ResponseWriter, r *http.Request) {
 			helmHandler.UpgradeHelmRelease(w, r)
 			return
 		}
+		if matchesPattern(path, "/api/v1/helm/releases/*/preview") && method == http.MethodPost {
+			helmHandler.PreviewHelmRelease(w, r)
+			return
+		}
 		if matchesPattern(path, "/api/v1/helm/releases/*"):
 			if method == http.MethodGet {
 				helmHandler.GetHelmRelease(w, r)
@@ -624,9 +2020,111 @@ func API(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// App catalog endpoints
+	if strings.HasPrefix(path, "/api/v1/app-catalog/") && appCatalogHandler != nil {
+		switch {
+		case path == "/api/v1/app-catalog/apps" && method == http.MethodGet:
+			appCatalogHandler.ListApps(w, r)
+		case matchesPattern(path, "/api/v1/app-catalog/apps/*/install") && method == http.MethodPost:
+			appCatalogHandler.InstallApp(w, r)
+		case matchesPattern(path, "/api/v1/app-catalog/apps/*") && method == http.MethodGet:
+			appCatalogHandler.GetApp(w, r)
+		case path == "/api/v1/app-catalog/installations" && method == http.MethodGet:
+			appCatalogHandler.ListInstallations(w, r)
+		case matchesPattern(path, "/api/v1/app-catalog/installations/*/upgrade") && method == http.MethodPost:
+			appCatalogHandler.UpgradeInstallation(w, r)
+		case matchesPattern(path, "/api/v1/app-catalog/installations/*/check") && method == http.MethodPost:
+			appCatalogHandler.CheckInstallation(w, r)
+		case matchesPattern(path, "/api/v1/app-catalog/installations/*") && method == http.MethodGet:
+			appCatalogHandler.GetInstallation(w, r)
+		case matchesPattern(path, "/api/v1/app-catalog/installations/*") && method == http.MethodDelete:
+			appCatalogHandler.UninstallInstallation(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "App catalog operation not found")
+		}
+		return
+	}
+
+	// GitOps endpoints
+	if strings.HasPrefix(path, "/api/v1/gitops/") && gitOpsHandler != nil {
+		switch {
+		case path == "/api/v1/gitops/sources" && method == http.MethodGet:
+			gitOpsHandler.ListSources(w, r)
+		case path == "/api/v1/gitops/sources" && method == http.MethodPost:
+			gitOpsHandler.CreateSource(w, r)
+		case matchesPattern(path, "/api/v1/gitops/sources/*/sync") && method == http.MethodPost:
+			gitOpsHandler.SyncSource(w, r)
+		case matchesPattern(path, "/api/v1/gitops/sources/*/rollback") && method == http.MethodPost:
+			gitOpsHandler.RollbackSource(w, r)
+		case matchesPattern(path, "/api/v1/gitops/sources/*/syncs") && method == http.MethodGet:
+			gitOpsHandler.ListSyncs(w, r)
+		case matchesPattern(path, "/api/v1/gitops/sources/*") && method == http.MethodGet:
+			gitOpsHandler.GetSource(w, r)
+		case matchesPattern(path, "/api/v1/gitops/sources/*") && (method == http.MethodPut || method == http.MethodPatch):
+			gitOpsHandler.UpdateSource(w, r)
+		case matchesPattern(path, "/api/v1/gitops/sources/*") && method == http.MethodDelete:
+			gitOpsHandler.DeleteSource(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "GitOps operation not found")
+		}
+		return
+	}
+
+	// Deployment pipeline endpoints; CI posts to the inbound webhook, which is public and signed with the pipeline's secret
+	if strings.HasPrefix(path, "/api/v1/pipelines") && pipelineHandler != nil {
+		switch {
+		case matchesPattern(path, "/api/v1/pipelines/inbound/*") && method == http.MethodPost:
+			pipelineHandler.Inbound(w, r)
+		case path == "/api/v1/pipelines" && method == http.MethodGet:
+			pipelineHandler.ListPipelines(w, r)
+		case path == "/api/v1/pipelines" && method == http.MethodPost:
+			pipelineHandler.CreatePipeline(w, r)
+		case matchesPattern(path, "/api/v1/pipelines/*/run") && method == http.MethodPost:
+			pipelineHandler.TriggerPipeline(w, r)
+		case matchesPattern(path, "/api/v1/pipelines/*/runs") && method == http.MethodGet:
+			pipelineHandler.ListRuns(w, r)
+		case matchesPattern(path, "/api/v1/pipelines/*/rotate-secret") && method == http.MethodPost:
+			pipelineHandler.RotateSecret(w, r)
+		case matchesPattern(path, "/api/v1/pipelines/*") && method == http.MethodGet:
+			pipelineHandler.GetPipeline(w, r)
+		case matchesPattern(path, "/api/v1/pipelines/*") && (method == http.MethodPut || method == http.MethodPatch):
+			pipelineHandler.UpdatePipeline(w, r)
+		case matchesPattern(path, "/api/v1/pipelines/*") && method == http.MethodDelete:
+			pipelineHandler.DeletePipeline(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Deployment pipeline operation not found")
+		}
+		return
+	}
+
+	// Canary and blue/green rollout endpoints
+	if strings.HasPrefix(path, "/api/v1/rollouts") && canaryHandler != nil {
+		switch {
+		case path == "/api/v1/rollouts" && method == http.MethodGet:
+			canaryHandler.ListRollouts(w, r)
+		case path == "/api/v1/rollouts" && method == http.MethodPost:
+			canaryHandler.CreateRollout(w, r)
+		case matchesPattern(path, "/api/v1/rollouts/*/promote") && method == http.MethodPost:
+			canaryHandler.PromoteRollout(w, r)
+		case matchesPattern(path, "/api/v1/rollouts/*/abort") && method == http.MethodPost:
+			canaryHandler.AbortRollout(w, r)
+		case matchesPattern(path, "/api/v1/rollouts/*") && method == http.MethodGet:
+			canaryHandler.GetRollout(w, r)
+		case matchesPattern(path, "/api/v1/rollouts/*") && method == http.MethodDelete:
+			canaryHandler.DeleteRollout(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Canary rollout operation not found")
+		}
+		return
+	}
+
 	// OpenTelemetry collector endpoints
 	if strings.HasPrefix(path, "/api/v1/otel") && otelHandler != nil {
 		switch {
+		case path == "/api/v1/otel/render" && method == http.MethodPost:
+			otelHandler.RenderConfig(w, r)
+		case path == "/api/v1/otel/validate" && method == http.MethodPost:
+			otelHandler.ValidateConfig(w, r)
 		case path == "/api/v1/otel/collectors" && method == http.MethodGet:
 			otelHandler.ListCollectors(w, r)
 		case path == "/api/v1/otel/collectors" && method == http.MethodPost:
@@ -639,6 +2137,8 @@ func API(w http.ResponseWriter, r *http.Request) {
 			otelHandler.StopCollector(w, r)
 		case matchesPattern(path, "/api/v1/otel/collectors/*/restart") && method == http.MethodPost:
 			otelHandler.RestartCollector(w, r)
+		case matchesPattern(path, "/api/v1/otel/collectors/*/validate") && method == http.MethodPost:
+			otelHandler.ValidateCollector(w, r)
 		case matchesPattern(path, "/api/v1/otel/collectors/*"):
 			if method == http.MethodGet {
 				otelHandler.GetCollector(w, r)
@@ -655,6 +2155,28 @@ func API(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Dashboard share link endpoints
+	if matchesPattern(path, "/api/v1/prometheus/dashboards/*/share-links") ||
+		(strings.HasPrefix(path, "/api/v1/prometheus/dashboards/") && strings.Contains(path, "/share-links/")) {
+		if dashboardShareHandler == nil {
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Share link operation not found")
+			return
+		}
+		switch {
+		case matchesPattern(path, "/api/v1/prometheus/dashboards/*/share-links") && method == http.MethodGet:
+			dashboardShareHandler.ListShareLinks(w, r)
+		case matchesPattern(path, "/api/v1/prometheus/dashboards/*/share-links") && method == http.MethodPost:
+			dashboardShareHandler.CreateShareLink(w, r)
+		case matchesPattern(path, "/api/v1/prometheus/dashboards/*/share-links/*") && method == http.MethodDelete:
+			dashboardShareHandler.RevokeShareLink(w, r)
+		case matchesPattern(path, "/api/v1/prometheus/dashboards/*/share-links/*/accesses") && method == http.MethodGet:
+			dashboardShareHandler.ListShareLinkAccesses(w, r)
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Share link operation not found")
+		}
+		return
+	}
+
 	// Prometheus data source endpoints
 	if strings.HasPrefix(path, "/api/v1/prometheus") && prometheusHandler != nil {
 		// Query endpoints
@@ -662,6 +2184,47 @@ func API(w http.ResponseWriter, r *http.Request) {
 			prometheusHandler.ExecuteQuery(w, r)
 			return
 		}
+		// Query history endpoints
+		if path == "/api/v1/prometheus/query-history" {
+			switch method {
+			case http.MethodGet:
+				prometheusHandler.ListQueryHistory(w, r)
+			case http.MethodDelete:
+				prometheusHandler.ClearQueryHistory(w, r)
+			default:
+				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Query history operation not found")
+			}
+			return
+		}
+		// Saved query endpoints
+		if strings.HasPrefix(path, "/api/v1/prometheus/saved-queries") {
+			switch {
+			case path == "/api/v1/prometheus/saved-queries" && method == http.MethodGet:
+				prometheusHandler.ListSavedQueries(w, r)
+			case path == "/api/v1/prometheus/saved-queries" && method == http.MethodPost:
+				prometheusHandler.CreateSavedQuery(w, r)
+			case matchesPattern(path, "/api/v1/prometheus/saved-queries/*/run") && method == http.MethodPost:
+				prometheusHandler.RunSavedQuery(w, r)
+			case matchesPattern(path, "/api/v1/prometheus/saved-queries/*"):
+				if method == http.MethodGet {
+					prometheusHandler.GetSavedQuery(w, r)
+				} else if method == http.MethodPut || method == http.MethodPatch {
+					prometheusHandler.UpdateSavedQuery(w, r)
+				} else if method == http.MethodDelete {
+					prometheusHandler.DeleteSavedQuery(w, r)
+				} else {
+					respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Saved query operation not found")
+				}
+			default:
+				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Saved query operation not found")
+			}
+			return
+		}
+		// Query builder endpoint
+		if path == "/api/v1/prometheus/query-builder" && method == http.MethodPost {
+			prometheusHandler.BuildQuery(w, r)
+			return
+		}
 		// Test connection endpoint
 		if path == "/api/v1/prometheus/datasources/test" && method == http.MethodPost {
 			prometheusHandler.TestDataSource(w, r)
@@ -674,6 +2237,8 @@ func API(w http.ResponseWriter, r *http.Request) {
 				prometheusHandler.ListAlertRules(w, r)
 			case path == "/api/v1/prometheus/alert-rules" && method == http.MethodPost:
 				prometheusHandler.CreateAlertRule(w, r)
+			case path == "/api/v1/prometheus/alert-rules/preview" && method == http.MethodPost:
+				prometheusHandler.PreviewAlertRule(w, r)
 			case matchesPattern(path, "/api/v1/prometheus/alert-rules/*"):
 				if method == http.MethodGet {
 					prometheusHandler.GetAlertRule(w, r)
@@ -696,6 +2261,11 @@ func API(w http.ResponseWriter, r *http.Request) {
 				prometheusHandler.ListDashboards(w, r)
 			case path == "/api/v1/prometheus/dashboards" && method == http.MethodPost:
 				prometheusHandler.CreateDashboard(w, r)
+			case (matchesPattern(path, "/api/v1/prometheus/dashboards/*/render") ||
+				matchesPattern(path, "/api/v1/prometheus/dashboards/*/panels/*/render")) && method == http.MethodGet:
+				prometheusHandler.RenderDashboard(w, r)
+			case matchesPattern(path, "/api/v1/prometheus/dashboards/*/variables") && method == http.MethodGet:
+				prometheusHandler.GetDashboardVariables(w, r)
 			case matchesPattern(path, "/api/v1/prometheus/dashboards/*"):
 				if method == http.MethodGet {
 					prometheusHandler.GetDashboard(w, r)
@@ -750,6 +2320,8 @@ func API(w http.ResponseWriter, r *http.Request) {
 			switch {
 			case path == "/api/v1/grafana/dashboards" && method == http.MethodGet:
 				grafanaHandler.ListDashboards(w, r)
+			case matchesPattern(path, "/api/v1/grafana/dashboards/*/import") && method == http.MethodPost:
+				grafanaHandler.ImportDashboard(w, r)
 			case matchesPattern(path, "/api/v1/grafana/dashboards/*"):
 				if method == http.MethodGet {
 					grafanaHandler.GetDashboard(w, r)
@@ -815,6 +2387,74 @@ func API(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Trace endpoints
+	if strings.HasPrefix(path, "/api/v1/traces") && traceHandler != nil {
+		switch {
+		case path == "/api/v1/traces/datasources" && method == http.MethodGet:
+			traceHandler.ListDataSources(w, r)
+		case path == "/api/v1/traces/datasources" && method == http.MethodPost:
+			traceHandler.CreateDataSource(w, r)
+		case matchesPattern(path, "/api/v1/traces/datasources/*/test") && method == http.MethodPost:
+			traceHandler.TestDataSource(w, r)
+		case matchesPattern(path, "/api/v1/traces/datasources/*/search") && method == http.MethodGet:
+			traceHandler.SearchTraces(w, r)
+		case matchesPattern(path, "/api/v1/traces/datasources/*/traces/*") && method == http.MethodGet:
+			traceHandler.GetTrace(w, r)
+		case matchesPattern(path, "/api/v1/traces/datasources/*"):
+			if method == http.MethodGet {
+				traceHandler.GetDataSource(w, r)
+			} else if method == http.MethodPut || method == http.MethodPatch {
+				traceHandler.UpdateDataSource(w, r)
+			} else if method == http.MethodDelete {
+				traceHandler.DeleteDataSource(w, r)
+			} else {
+				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Trace operation not found")
+			}
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Trace operation not found")
+		}
+		return
+	}
+
+	// Log endpoints
+	if strings.HasPrefix(path, "/api/v1/logs") && logHandler != nil {
+		switch {
+		case path == "/api/v1/logs/datasources" && method == http.MethodGet:
+			logHandler.ListDataSources(w, r)
+		case path == "/api/v1/logs/datasources" && method == http.MethodPost:
+			logHandler.CreateDataSource(w, r)
+		case matchesPattern(path, "/api/v1/logs/datasources/*/test") && method == http.MethodPost:
+			logHandler.TestDataSource(w, r)
+		case matchesPattern(path, "/api/v1/logs/datasources/*/query") && method == http.MethodGet:
+			logHandler.QueryLogs(w, r)
+		case matchesPattern(path, "/api/v1/logs/datasources/*"):
+			if method == http.MethodGet {
+				logHandler.GetDataSource(w, r)
+			} else if method == http.MethodPut || method == http.MethodPatch {
+				logHandler.UpdateDataSource(w, r)
+			} else if method == http.MethodDelete {
+				logHandler.DeleteDataSource(w, r)
+			} else {
+				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Log operation not found")
+			}
+		default:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Log operation not found")
+		}
+		return
+	}
+
+	// Correlated metrics, logs and traces for one resource
+	if path == "/api/v1/explore/correlate" && method == http.MethodPost && exploreHandler != nil {
+		exploreHandler.Correlate(w, r)
+		return
+	}
+
+	// Candidate traces for an anomaly
+	if matchesPattern(path, "/api/v1/ai/anomaly-events/*/traces") && method == http.MethodGet && traceHandler != nil {
+		traceHandler.GetAnomalyTraces(w, r)
+		return
+	}
+
 	// AI Analysis endpoints
 	if strings.HasPrefix(path, "/api/v1/ai") && aiAnalysisHandler != nil {
 		// Anomaly detection endpoints
@@ -851,6 +2491,15 @@ func API(w http.ResponseWriter, r *http.Request) {
 			}
 			return
 		}
+		// LLM usage endpoint
+		if path == "/api/v1/ai/usage" {
+			if method == http.MethodGet {
+				aiAnalysisHandler.GetLLMUsage(w, r)
+			} else {
+				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "LLM usage operation not found")
+			}
+			return
+		}
 		// LLM conversations endpoints
 		if strings.HasPrefix(path, "/api/v1/ai/llm/conversations") {
 			switch {
@@ -858,6 +2507,12 @@ func API(w http.ResponseWriter, r *http.Request) {
 				aiAnalysisHandler.ListLLMConversations(w, r)
 			case path == "/api/v1/ai/llm/conversations" && method == http.MethodPost:
 				aiAnalysisHandler.CreateLLMConversation(w, r)
+			case matchesPattern(path, "/api/v1/ai/llm/conversations/*/messages") && method == http.MethodPost:
+				aiAnalysisHandler.SendLLMMessage(w, r)
+			case matchesPattern(path, "/api/v1/ai/llm/conversations/*/context-snapshots/*") && method == http.MethodGet:
+				aiAnalysisHandler.GetLLMContextSnapshot(w, r)
+			case matchesPattern(path, "/api/v1/ai/llm/conversations/*/tool-invocations") && method == http.MethodGet:
+				aiAnalysisHandler.ListLLMToolInvocations(w, r)
 			case matchesPattern(path, "/api/v1/ai/llm/conversations/*"):
 				if method == http.MethodGet {
 					aiAnalysisHandler.GetLLMConversation(w, r)
@@ -871,11 +2526,16 @@ func API(w http.ResponseWriter, r *http.Request) {
 			}
 			return
 		}
-		// LLM message endpoints
-		if matchesPattern(path, "/api/v1/ai/llm/conversations/*/messages") && method == http.MethodPost {
-			aiAnalysisHandler.SendLLMMessage(w, r)
-			return
+	}
+
+	// Permission trace endpoint
+	if matchesPattern(path, "/api/v1/rbac/users/*/explain-permission") && permissionTraceHandler != nil {
+		if method == http.MethodPost {
+			permissionTraceHandler.ExplainPermission(w, r)
+		} else {
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Permission trace operation not found")
 		}
+		return
 	}
 
 	// RBAC endpoints
@@ -0,0 +1,106 @@
+// Package handler provides liveness, readiness and component health endpoints
+package handler
+
+import (
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	pkgdb "github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// HealthCheckHandler serves the health of the gateway and its dependencies
+type HealthCheckHandler struct {
+	db      *gorm.DB
+	health  *service.HealthService
+	latency *service.RouteLatencyService
+}
+
+// NewHealthCheckHandler creates a new health check handler
+func NewHealthCheckHandler(db *gorm.DB, health *service.HealthService) *HealthCheckHandler {
+	return &HealthCheckHandler{db: db, health: health}
+}
+
+// SetRouteLatency sets the service that tracks the latency of the gateway's
+// routes against their SLOs
+func (h *HealthCheckHandler) SetRouteLatency(latency *service.RouteLatencyService) {
+	h.latency = latency
+}
+
+// ComponentStatus is the public view of a component, without messages or details
+type ComponentStatus struct {
+	Name   string             `json:"name"`
+	Status model.HealthStatus `json:"status"`
+}
+
+// Live handles GET /health/live. It returns 503 once a background worker has crashed.
+func (h *HealthCheckHandler) Live(w http.ResponseWriter, r *http.Request) {
+	h.respondWithStatus(w, h.health.Live(r.Context()))
+}
+
+// Ready handles GET /health/ready. It returns 503 while a critical component is down.
+func (h *HealthCheckHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	h.respondWithStatus(w, h.health.Ready(r.Context()))
+}
+
+// Metrics handles GET /health/metrics, the database circuit breaker and pool
+// counters in the Prometheus text format
+func (h *HealthCheckHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if guard := pkgdb.GuardOf(h.db); guard != nil {
+		guard.WriteMetrics(w)
+	}
+}
+
+// Details handles GET /api/v1/health/details, the full report for administrators.
+// It always answers 200 so the report is readable while the service is down.
+func (h *HealthCheckHandler) Details(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "system", "health", nil, "") {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, h.health.Ready(r.Context()))
+}
+
+// Latency handles GET /api/v1/health/latency, the p95 and p99 of the routes
+// this gateway served recently against their thresholds
+func (h *HealthCheckHandler) Latency(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "system", "health", nil, "") {
+		return
+	}
+	if h.latency == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Latency tracking not available")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"routes": h.latency.Report(),
+	})
+}
+
+// respondWithStatus writes the unauthenticated view of report
+func (h *HealthCheckHandler) respondWithStatus(w http.ResponseWriter, report *model.HealthReport) {
+	components := make([]ComponentStatus, 0, len(report.Components))
+	for _, c := range report.Components {
+		components = append(components, ComponentStatus{Name: c.Name, Status: c.Status})
+	}
+
+	status := http.StatusOK
+	if report.Status == model.HealthStatusDown {
+		status = http.StatusServiceUnavailable
+	}
+	respondWithJSON(w, status, map[string]interface{}{
+		"status":     report.Status,
+		"checkedAt":  report.CheckedAt,
+		"components": components,
+	})
+}
@@ -3,23 +3,28 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/db"
 	"github.com/wangjialin/myops/pkg/model"
 	"gorm.io/gorm"
 )
 
 // HelmHandler handles Helm repository operations
 type HelmHandler struct {
-	db *gorm.DB
+	db       *gorm.DB
+	repos    *service.HelmRepoService
+	releases *service.HelmReleaseService
 }
 
 // NewHelmHandler creates a new Helm handler
-func NewHelmHandler(db *gorm.DB) *HelmHandler {
-	return &HelmHandler{db: db}
+func NewHelmHandler(db *gorm.DB, repos *service.HelmRepoService, releases *service.HelmReleaseService) *HelmHandler {
+	return &HelmHandler{db: db, repos: repos, releases: releases}
 }
 
 // CreateHelmRepo creates a new Helm repository
@@ -30,51 +35,14 @@ func (h *HelmHandler) CreateHelmRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	repo, err := h.repos.Create(r.Context(), userID, &req)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
-		return
-	}
-
-	// Check if repository name already exists for this user
-	var existingRepo model.HelmRepository
-	if err := h.db.Where("user_id = ? AND name = ?", userUUID, req.Name).First(&existingRepo).Error; err == nil {
-		respondWithError(w, http.StatusConflict, "CONFLICT", "Repository name already exists")
-		return
-	}
-
-	// Create repository
-	repo := model.HelmRepository{
-		ID:              uuid.New(),
-		UserID:          userUUID,
-		Name:            req.Name,
-		Description:     req.Description,
-		Type:            req.Type,
-		Status:          model.HelmRepoStatusActive,
-		URL:             req.URL,
-		Username:        req.Username,
-		Password:        req.Password, // Should be encrypted in production
-		CAFile:          req.CAFile,
-		CertFile:        req.CertFile,
-		KeyFile:         req.KeyFile,
-		InsecureSkipTLS: req.InsecureSkipTLS,
-	}
-
-	if err := h.db.Create(&repo).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create repository")
+		respondWithHelmRepoError(w, err, "Failed to create repository")
 		return
 	}
 
@@ -83,58 +51,21 @@ func (h *HelmHandler) CreateHelmRepo(w http.ResponseWriter, r *http.Request) {
 
 // ListHelmRepos lists all Helm repositories for the authenticated user
 func (h *HelmHandler) ListHelmRepos(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	page, pageSize := pageParams(r)
+	query := r.URL.Query()
+	repos, total, err := h.repos.List(r.Context(), &db.HelmRepoFilter{
+		UserID:   userID,
+		Status:   model.HelmRepoStatus(query.Get("status")),
+		Type:     model.HelmRepoType(query.Get("type")),
+		Page:     page,
+		PageSize: pageSize,
+	})
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
-		return
-	}
-
-	// Parse query parameters
-	page := 1
-	pageSize := 20
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
-		}
-	}
-	if pageSizeStr := r.URL.Query().Get("pageSize"); pageSizeStr != "" {
-		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= 100 {
-			pageSize = ps
-		}
-	}
-
-	// Build query
-	query := h.db.Model(&model.HelmRepository{}).Where("user_id = ?", userUUID)
-
-	// Apply filters
-	if status := r.URL.Query().Get("status"); status != "" {
-		query = query.Where("status = ?", status)
-	}
-	if repoType := r.URL.Query().Get("type"); repoType != "" {
-		query = query.Where("type = ?", repoType)
-	}
-
-	// Count total
-	var total int64
-	query.Count(&total)
-
-	// Fetch repositories
-	var repos []model.HelmRepository
-	offset := (page - 1) * pageSize
-	if err := query.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&repos).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch repositories")
 		return
 	}
@@ -150,47 +81,18 @@ func (h *HelmHandler) ListHelmRepos(w http.ResponseWriter, r *http.Request) {
 
 // GetHelmRepo gets a specific Helm repository
 func (h *HelmHandler) GetHelmRepo(w http.ResponseWriter, r *http.Request) {
-	// Extract repo ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 4 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid repository ID")
-		return
-	}
-
-	repoID := parts[3]
-	repoUUID, err := uuid.Parse(repoID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid repository ID format")
-		return
-	}
-
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+	repoID, ok := pathUUID(w, r, 4, "repository")
+	if !ok {
 		return
 	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	repo, err := h.repos.Get(r.Context(), repoID, userID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
-		return
-	}
-
-	// Fetch repository
-	var repo model.HelmRepository
-	if err := h.db.Where("id = ? AND user_id = ?", repoUUID, userUUID).First(&repo).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Repository not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch repository")
-		}
+		respondWithHelmRepoError(w, err, "Failed to fetch repository")
 		return
 	}
 
@@ -199,17 +101,8 @@ func (h *HelmHandler) GetHelmRepo(w http.ResponseWriter, r *http.Request) {
 
 // UpdateHelmRepo updates a Helm repository
 func (h *HelmHandler) UpdateHelmRepo(w http.ResponseWriter, r *http.Request) {
-	// Extract repo ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 4 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid repository ID")
-		return
-	}
-
-	repoID := parts[3]
-	repoUUID, err := uuid.Parse(repoID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid repository ID format")
+	repoID, ok := pathUUID(w, r, 4, "repository")
+	if !ok {
 		return
 	}
 
@@ -219,129 +112,33 @@ func (h *HelmHandler) UpdateHelmRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	repo, err := h.repos.Update(r.Context(), repoID, userID, &req)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
+		respondWithHelmRepoError(w, err, "Failed to update repository")
 		return
 	}
 
-	// Fetch repository
-	var repo model.HelmRepository
-	if err := h.db.Where("id = ? AND user_id = ?", repoUUID, userUUID).First(&repo).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Repository not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch repository")
-		}
-		return
-	}
-
-	// Update fields
-	updates := map[string]interface{}{}
-	if req.Name != "" {
-		// Check if new name conflicts
-		var existingRepo model.HelmRepository
-		if err := h.db.Where("user_id = ? AND name = ? AND id != ?", userUUID, req.Name, repoUUID).First(&existingRepo).Error; err == nil {
-			respondWithError(w, http.StatusConflict, "CONFLICT", "Repository name already exists")
-			return
-		}
-		updates["name"] = req.Name
-	}
-	if req.Description != "" {
-		updates["description"] = req.Description
-	}
-	if req.URL != "" {
-		updates["url"] = req.URL
-	}
-	if req.Username != "" {
-		updates["username"] = req.Username
-	}
-	if req.Password != "" {
-		updates["password"] = req.Password
-	}
-	if req.CAFile != "" {
-		updates["ca_file"] = req.CAFile
-	}
-	if req.CertFile != "" {
-		updates["cert_file"] = req.CertFile
-	}
-	if req.KeyFile != "" {
-		updates["key_file"] = req.KeyFile
-	}
-	updates["insecure_skip_tls"] = req.InsecureSkipTLS
-
-	if err := h.db.Model(&repo).Updates(updates).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update repository")
-		return
-	}
-
-	// Fetch updated repo
-	h.db.First(&repo, repoUUID)
 	respondWithJSON(w, http.StatusOK, repo)
 }
 
 // DeleteHelmRepo deletes a Helm repository
 func (h *HelmHandler) DeleteHelmRepo(w http.ResponseWriter, r *http.Request) {
-	// Extract repo ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 4 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid repository ID")
-		return
-	}
-
-	repoID := parts[3]
-	repoUUID, err := uuid.Parse(repoID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid repository ID format")
-		return
-	}
-
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	repoID, ok := pathUUID(w, r, 4, "repository")
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
-
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
-		return
-	}
-
-	// Check ownership
-	var repo model.HelmRepository
-	if err := h.db.Where("id = ? AND user_id = ?", repoUUID, userUUID).First(&repo).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Repository not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch repository")
-		}
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// Delete repository
-	if err := h.db.Delete(&repo).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete repository")
+	if err := h.repos.Delete(r.Context(), repoID, userID); err != nil {
+		respondWithHelmRepoError(w, err, "Failed to delete repository")
 		return
 	}
 
@@ -371,47 +168,17 @@ func (h *HelmHandler) TestHelmRepo(w http.ResponseWriter, r *http.Request) {
 
 // SyncHelmRepo syncs charts from a Helm repository
 func (h *HelmHandler) SyncHelmRepo(w http.ResponseWriter, r *http.Request) {
-	// Extract repo ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 5 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request")
-		return
-	}
-
-	repoID := parts[4]
-	repoUUID, err := uuid.Parse(repoID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid repository ID format")
-		return
-	}
-
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	repoID, ok := pathUUID(w, r, 4, "repository")
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
-
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// Fetch repository
-	var repo model.HelmRepository
-	if err := h.db.Where("id = ? AND user_id = ?", repoUUID, userUUID).First(&repo).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Repository not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch repository")
-		}
+	if _, err := h.repos.Get(r.Context(), repoID, userID); err != nil {
+		respondWithHelmRepoError(w, err, "Failed to fetch repository")
 		return
 	}
 
@@ -422,6 +189,36 @@ func (h *HelmHandler) SyncHelmRepo(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// respondWithHelmRepoError sends the status of a Helm repository service error
+func respondWithHelmRepoError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrHelmRepoNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Repository not found")
+	case errors.Is(err, service.ErrHelmRepoExists):
+		respondWithError(w, http.StatusConflict, "CONFLICT", "Repository name already exists")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
+
+// respondWithHelmReleaseError sends the status of a Helm release service error
+func respondWithHelmReleaseError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidHelmRelease):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrHelmReleaseNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Release not found")
+	case errors.Is(err, service.ErrHelmRevisionNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Revision not found")
+	case errors.Is(err, service.ErrClusterNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	case errors.Is(err, service.ErrHelmChartUnavailable):
+		respondWithError(w, http.StatusBadGateway, "CHART_UNAVAILABLE", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
+
 // ListHelmReleases lists all Helm releases for the authenticated user
 func (h *HelmHandler) ListHelmReleases(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
@@ -473,6 +270,11 @@ func (h *HelmHandler) ListHelmReleases(w http.ResponseWriter, r *http.Request) {
 	if status := r.URL.Query().Get("status"); status != "" {
 		query = query.Where("status = ?", status)
 	}
+	query, err = db.WithTags(query, model.TagResourceHelmRelease, r.URL.Query().Get("tags"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_SELECTOR", err.Error())
+		return
+	}
 
 	// Count total
 	var total int64
@@ -552,54 +354,17 @@ func (h *HelmHandler) InstallHelmRelease(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
-		return
-	}
-
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
-		return
-	}
-
-	// Verify cluster ownership
-	var cluster model.K8sCluster
-	if err := h.db.Where("id = ? AND user_id = ?", req.ClusterID, userUUID).First(&cluster).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch cluster")
-		}
 		return
 	}
 
 	// TODO: Implement actual Helm install using Helm Go SDK
-	// For now, create a placeholder release
-	release := model.HelmRelease{
-		ID:          uuid.New(),
-		UserID:      userUUID,
-		ClusterID:   req.ClusterID,
-		Namespace:   req.Namespace,
-		Name:        req.Name,
-		Revision:    1,
-		Status:      model.HelmReleaseStatusPending,
-		Chart:       req.Chart,
-		ChartVersion: req.ChartVersion,
-		Values:      req.Values,
-		Description: req.Description,
-	}
-
-	if err := h.db.Create(&release).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create release")
+	// For now, record a pending release
+	username, _ := r.Context().Value("username").(string)
+	release, err := h.releases.Install(r.Context(), userID, username, &req)
+	if err != nil {
+		respondWithHelmReleaseError(w, err, "Failed to create release")
 		return
 	}
 
@@ -611,17 +376,8 @@ func (h *HelmHandler) InstallHelmRelease(w http.ResponseWriter, r *http.Request)
 
 // UpgradeHelmRelease upgrades a Helm release
 func (h *HelmHandler) UpgradeHelmRelease(w http.ResponseWriter, r *http.Request) {
-	// Extract release ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 5 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid release ID")
-		return
-	}
-
-	releaseID := parts[4]
-	releaseUUID, err := uuid.Parse(releaseID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid release ID format")
+	releaseID, ok := pathUUID(w, r, 4, "release")
+	if !ok {
 		return
 	}
 
@@ -631,55 +387,59 @@ func (h *HelmHandler) UpgradeHelmRelease(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	userID, ok := userIDVal.(string)
+	// TODO: Implement actual Helm upgrade using Helm Go SDK
+	username, _ := r.Context().Value("username").(string)
+	release, err := h.releases.Upgrade(r.Context(), userID, username, releaseID, &req)
+	if err != nil {
+		respondWithHelmReleaseError(w, err, "Failed to upgrade release")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Release upgrade initiated (Helm SDK integration pending)",
+		"release": release,
+	})
+}
+
+// PreviewHelmRelease validates the values of an upgrade and returns the diff
+// of its rendered manifests against the deployed release
+func (h *HelmHandler) PreviewHelmRelease(w http.ResponseWriter, r *http.Request) {
+	releaseID, ok := pathUUID(w, r, 4, "release")
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
+	var req model.UpdateHelmReleaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
 		return
 	}
 
-	// Fetch release
-	var release model.HelmRelease
-	if err := h.db.Where("id = ? AND user_id = ?", releaseUUID, userUUID).First(&release).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Release not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch release")
-		}
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	preview, err := h.releases.Preview(r.Context(), userID, releaseID, &req)
+	if err != nil {
+		respondWithHelmReleaseError(w, err, "Failed to preview release upgrade")
 		return
 	}
 
-	// TODO: Implement actual Helm upgrade using Helm Go SDK
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"message": "Release upgrade not yet implemented",
+		"preview": preview,
 	})
 }
 
 // RollbackHelmRelease rolls back a Helm release
 func (h *HelmHandler) RollbackHelmRelease(w http.ResponseWriter, r *http.Request) {
-	// Extract release ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 5 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid release ID")
-		return
-	}
-
-	releaseID := parts[4]
-	releaseUUID, err := uuid.Parse(releaseID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid release ID format")
+	releaseID, ok := pathUUID(w, r, 4, "release")
+	if !ok {
 		return
 	}
 
@@ -689,39 +449,22 @@ func (h *HelmHandler) RollbackHelmRelease(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	// TODO: Implement actual Helm rollback using Helm Go SDK
+	username, _ := r.Context().Value("username").(string)
+	release, err := h.releases.Rollback(userID, username, releaseID, &req)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
-		return
-	}
-
-	// Fetch release
-	var release model.HelmRelease
-	if err := h.db.Where("id = ? AND user_id = ?", releaseUUID, userUUID).First(&release).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Release not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch release")
-		}
+		respondWithHelmReleaseError(w, err, "Failed to roll back release")
 		return
 	}
 
-	// TODO: Implement actual Helm rollback using Helm Go SDK
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"message": "Release rollback not yet implemented",
+		"message": "Release rollback initiated (Helm SDK integration pending)",
+		"release": release,
 	})
 }
 
@@ -785,63 +528,24 @@ func (h *HelmHandler) UninstallHelmRelease(w http.ResponseWriter, r *http.Reques
 
 // GetHelmReleaseHistory gets the history of a Helm release
 func (h *HelmHandler) GetHelmReleaseHistory(w http.ResponseWriter, r *http.Request) {
-	// Extract release ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 6 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request")
-		return
-	}
-
-	releaseID := parts[4]
-	releaseUUID, err := uuid.Parse(releaseID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid release ID format")
-		return
-	}
-
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+	releaseID, ok := pathUUID(w, r, 4, "release")
+	if !ok {
 		return
 	}
 
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	history, err := h.releases.History(userID, releaseID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
-		return
-	}
-
-	// Fetch release
-	var release model.HelmRelease
-	if err := h.db.Where("id = ? AND user_id = ?", releaseUUID, userUUID).First(&release).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Release not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch release")
-		}
+		respondWithHelmReleaseError(w, err, "Failed to fetch release history")
 		return
 	}
 
-	// TODO: Implement actual Helm history using Helm Go SDK
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"history": []model.HelmReleaseHistory{
-			{
-				Revision:     release.Revision,
-				Updated:      release.Updated,
-				Status:       release.Status,
-				Chart:        release.Chart,
-				ChartVersion: release.ChartVersion,
-				AppVersion:   release.AppVersion,
-				Description:  release.Description,
-			},
-		},
+		"history": history,
 	})
 }
 
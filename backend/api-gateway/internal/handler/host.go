@@ -8,13 +8,17 @@ import (
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/db"
 	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
 	"gorm.io/gorm"
 )
 
 // HostHandler handles host HTTP requests
 type HostHandler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	events *service.EventBus
 }
 
 // NewHostHandler creates a new HostHandler
@@ -22,6 +26,11 @@ func NewHostHandler(db *gorm.DB) *HostHandler {
 	return &HostHandler{db: db}
 }
 
+// SetEventBus sets the bus host events are published on
+func (h *HostHandler) SetEventBus(events *service.EventBus) {
+	h.events = events
+}
+
 // CreateHostRequest represents a create host request
 type CreateHostRequest struct {
 	Hostname  string            `json:"hostname"`
@@ -35,6 +44,7 @@ type CreateHostRequest struct {
 	Labels    map[string]string `json:"labels"`
 	Tags      []string          `json:"tags"`
 	ClusterID *string           `json:"clusterId"`
+	Group     *string           `json:"group"`
 }
 
 // UpdateHostRequest represents an update host request
@@ -49,6 +59,26 @@ type UpdateHostRequest struct {
 	Labels    map[string]string `json:"labels"`
 	Tags      []string          `json:"tags"`
 	ClusterID *string           `json:"clusterId"`
+	Group     *string           `json:"group"`
+}
+
+// hostStatuses are the statuses hosts may be filtered by
+var hostStatuses = []string{
+	string(model.HostStatusPending),
+	string(model.HostStatusApproved),
+	string(model.HostStatusRejected),
+	string(model.HostStatusOffline),
+	string(model.HostStatusOnline),
+	string(model.HostStatusDegraded),
+}
+
+// hostLifecycles are the lifecycle states hosts may be filtered by
+var hostLifecycles = []string{
+	string(model.HostLifecycleProvisioning),
+	string(model.HostLifecycleActive),
+	string(model.HostLifecycleMaintenance),
+	string(model.HostLifecycleDecommissioning),
+	string(model.HostLifecycleRetired),
 }
 
 // HostFilter represents filter options for listing hosts
@@ -56,8 +86,10 @@ type HostFilter struct {
 	Page        int              `json:"page"`
 	PageSize    int              `json:"pageSize"`
 	Status      model.HostStatus `json:"status"`
+	Lifecycle   string           `json:"lifecycle"`
 	Hostname    string           `json:"hostname"`
 	IPAddress   string           `json:"ipAddress"`
+	Group       *string          `json:"group"`
 	RegisteredBy *uuid.UUID      `json:"registeredBy"`
 	Labels      map[string]string `json:"labels"`
 	Tags        []string         `json:"tags"`
@@ -129,7 +161,7 @@ func (h *HostHandler) getHost(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"data":      host,
-		"requestId": generateRequestID(),
+		"requestId": responseRequestID(w),
 	})
 }
 
@@ -145,13 +177,40 @@ func (h *HostHandler) listHosts(w http.ResponseWriter, r *http.Request) {
 
 	// Apply filters
 	if filter.Status != "" {
-		dbQuery = dbQuery.Where("status = ?", filter.Status)
+		// Several statuses may be given, e.g. status=degraded,offline
+		statuses := strings.Split(string(filter.Status), ",")
+		if err := sanitize.OneOf(statuses, hostStatuses...); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_FILTER", err.Error())
+			return
+		}
+		dbQuery = dbQuery.Where("status IN ?", statuses)
+	}
+	if filter.Lifecycle != "" {
+		// Several states may be given, e.g. lifecycle=active,maintenance
+		states := strings.Split(filter.Lifecycle, ",")
+		if err := sanitize.OneOf(states, hostLifecycles...); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_FILTER", err.Error())
+			return
+		}
+		dbQuery = dbQuery.Where("lifecycle IN ?", states)
 	}
 	if filter.Hostname != "" {
-		dbQuery = dbQuery.Where("hostname ILIKE ?", "%"+filter.Hostname+"%")
+		dbQuery = dbQuery.Where("hostname ILIKE ?", sanitize.Contains(filter.Hostname))
 	}
 	if filter.IPAddress != "" {
-		dbQuery = dbQuery.Where("ip_address ILIKE ?", "%"+filter.IPAddress+"%")
+		dbQuery = dbQuery.Where("ip_address ILIKE ?", sanitize.Contains(filter.IPAddress))
+	}
+	if filter.Group != nil {
+		// group= lists the ungrouped hosts
+		dbQuery = dbQuery.Where("host_group = ?", *filter.Group)
+	}
+	if filter.SortBy != "" {
+		order, err := db.HostSortColumns.Order(filter.SortBy, filter.SortDesc)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_SORT", err.Error())
+			return
+		}
+		dbQuery = dbQuery.Order(order)
 	}
 
 	// Count total
@@ -184,7 +243,7 @@ func (h *HostHandler) listHosts(w http.ResponseWriter, r *http.Request) {
 			"page":  filter.Page,
 			"pageSize": filter.PageSize,
 		},
-		"requestId": generateRequestID(),
+		"requestId": responseRequestID(w),
 	})
 }
 
@@ -214,6 +273,9 @@ func (h *HostHandler) createHost(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
 		return
 	}
+	if userID != uuid.Nil && !enforceQuota(w, userID, model.QuotaResourceHosts, 1) {
+		return
+	}
 
 	host := &model.Host{
 		ID:          uuid.New(),
@@ -221,6 +283,7 @@ func (h *HostHandler) createHost(w http.ResponseWriter, r *http.Request) {
 		IPAddress:   req.IPAddress,
 		Port:        req.Port,
 		Status:      model.HostStatusPending,
+		Lifecycle:   model.HostLifecycleProvisioning,
 		OSType:      req.OSType,
 		OSVersion:   req.OSVersion,
 		CPUCores:    req.CPUCores,
@@ -239,16 +302,29 @@ func (h *HostHandler) createHost(w http.ResponseWriter, r *http.Request) {
 		}
 		host.ClusterID = &clusterID
 	}
+	if req.Group != nil {
+		if err := service.ValidateHostGroup(*req.Group); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_GROUP", err.Error())
+			return
+		}
+		host.Group = *req.Group
+	}
 
 	if err := h.db.Create(host).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
 		return
 	}
 
+	attrs := map[string]string{"hostId": host.ID.String(), "osType": host.OSType}
+	if host.ClusterID != nil {
+		attrs["clusterId"] = host.ClusterID.String()
+	}
+	h.events.Publish(userID, model.EventHostAdded, attrs, host)
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"data":      host,
-		"requestId": generateRequestID(),
+		"requestId": responseRequestID(w),
 	})
 }
 
@@ -325,6 +401,13 @@ func (h *HostHandler) updateHost(w http.ResponseWriter, r *http.Request) {
 			updates["cluster_id"] = clusterID
 		}
 	}
+	if req.Group != nil {
+		if err := service.ValidateHostGroup(*req.Group); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_GROUP", err.Error())
+			return
+		}
+		updates["host_group"] = *req.Group
+	}
 
 	if err := h.db.Model(&host).Updates(updates).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
@@ -337,7 +420,7 @@ func (h *HostHandler) updateHost(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"data":      host,
-		"requestId": generateRequestID(),
+		"requestId": responseRequestID(w),
 	})
 }
 
@@ -425,7 +508,7 @@ func (h *HostHandler) approveHost(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"data":      host,
-		"requestId": generateRequestID(),
+		"requestId": responseRequestID(w),
 	})
 }
 
@@ -515,7 +598,7 @@ func (h *HostHandler) rejectHost(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"data":      host,
-		"requestId": generateRequestID(),
+		"requestId": responseRequestID(w),
 	})
 }
 
@@ -539,12 +622,24 @@ func buildHostFilter(query map[string][]string) *HostFilter {
 	if status, ok := query["status"]; ok && len(status) > 0 {
 		filter.Status = model.HostStatus(status[0])
 	}
+	if lifecycle, ok := query["lifecycle"]; ok && len(lifecycle) > 0 {
+		filter.Lifecycle = lifecycle[0]
+	}
 	if hostname, ok := query["hostname"]; ok && len(hostname) > 0 {
 		filter.Hostname = hostname[0]
 	}
 	if ipAddress, ok := query["ip_address"]; ok && len(ipAddress) > 0 {
 		filter.IPAddress = ipAddress[0]
 	}
+	if group, ok := query["group"]; ok && len(group) > 0 {
+		filter.Group = &group[0]
+	}
+	if sortBy, ok := query["sort_by"]; ok && len(sortBy) > 0 {
+		filter.SortBy = sortBy[0]
+	}
+	if sortDesc, ok := query["sort_desc"]; ok && len(sortDesc) > 0 {
+		filter.SortDesc = sortDesc[0] == "true"
+	}
 
 	return filter
 }
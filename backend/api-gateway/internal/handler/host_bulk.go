@@ -0,0 +1,214 @@
+// Package handler provides HTTP handlers for bulk host actions
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
+	"gorm.io/gorm"
+)
+
+// hostBulkApprovalStatuses are the statuses approvals may be filtered by
+var hostBulkApprovalStatuses = []string{
+	string(model.HostBulkApprovalPending),
+	string(model.HostBulkApprovalApproved),
+	string(model.HostBulkApprovalRejected),
+	string(model.HostBulkApprovalExpired),
+}
+
+// HostBulkHandler handles actions on many hosts at once and the approval of the
+// destructive ones
+type HostBulkHandler struct {
+	db   *gorm.DB
+	bulk *service.HostBulkService
+}
+
+// NewHostBulkHandler creates a new bulk host action handler
+func NewHostBulkHandler(db *gorm.DB, bulk *service.HostBulkService) *HostBulkHandler {
+	return &HostBulkHandler{db: db, bulk: bulk}
+}
+
+// Apply applies an action to the hosts of the request (POST
+// /api/v1/hosts/bulk/{action}). Each host needs the permission of the action,
+// and failing hosts do not stop the others. Deleting and retiring hosts waits
+// for another user's approval: these respond 202 with the approval instead.
+func (h *HostBulkHandler) Apply(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	action := model.HostBulkAction(splitPath(r.URL.Path)[4])
+
+	var req model.HostBulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	if action.Destructive() {
+		approval, err := h.bulk.RequestApproval(r.Context(), userID, action, &req)
+		if err != nil {
+			respondWithHostBulkError(w, err, "Failed to request approval")
+			return
+		}
+		respondWithJSON(w, http.StatusAccepted, approval)
+		return
+	}
+
+	result, err := h.bulk.Apply(r.Context(), userID, action, &req)
+	if err != nil {
+		respondWithHostBulkError(w, err, "Failed to apply bulk action")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// ListApprovals returns a page of bulk action approvals, optionally of ?status
+// only (GET /api/v1/hosts/bulk/approvals)
+func (h *HostBulkHandler) ListApprovals(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "list", nil, "") {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" {
+		if err := sanitize.OneOf([]string{status}, hostBulkApprovalStatuses...); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_FILTER", err.Error())
+			return
+		}
+	}
+	page, pageSize := pageParams(r)
+
+	approvals, total, err := h.bulk.ListApprovals(r.Context(), model.HostBulkApprovalStatus(status), page, pageSize)
+	if err != nil {
+		respondWithHostBulkError(w, err, "Failed to list approvals")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":       approvals,
+		"total":      total,
+		"page":       page,
+		"pageSize":   pageSize,
+		"totalPages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// GetApproval returns a bulk action approval (GET /api/v1/hosts/bulk/approvals/{id})
+func (h *HostBulkHandler) GetApproval(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "list", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 5, "approval")
+	if !ok {
+		return
+	}
+
+	approval, err := h.bulk.GetApproval(r.Context(), id)
+	if err != nil {
+		respondWithHostBulkError(w, err, "Failed to retrieve approval")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, approval)
+}
+
+// ApproveApproval approves a pending bulk action and applies it, responding
+// with its result (POST /api/v1/hosts/bulk/approvals/{id}/approve). Approvers
+// need hosts.bulk_approve and cannot approve their own actions.
+func (h *HostBulkHandler) ApproveApproval(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "bulk_approve", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 5, "approval")
+	if !ok {
+		return
+	}
+	var req model.HostBulkReviewRequest
+	if !decodeHostBulkReview(w, r, &req) {
+		return
+	}
+
+	approval, err := h.bulk.Approve(r.Context(), id, userID, req.Comment)
+	if err != nil {
+		respondWithHostBulkError(w, err, "Failed to approve bulk action")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, approval)
+}
+
+// RejectApproval rejects a pending bulk action (POST
+// /api/v1/hosts/bulk/approvals/{id}/reject). Requesters may reject their own
+// to withdraw it; others need hosts.bulk_approve.
+func (h *HostBulkHandler) RejectApproval(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 5, "approval")
+	if !ok {
+		return
+	}
+	var req model.HostBulkReviewRequest
+	if !decodeHostBulkReview(w, r, &req) {
+		return
+	}
+
+	approval, err := h.bulk.GetApproval(r.Context(), id)
+	if err != nil {
+		respondWithHostBulkError(w, err, "Failed to reject bulk action")
+		return
+	}
+	if approval.RequestedBy != userID && !requirePermission(w, h.db, userID, "hosts", "bulk_approve", nil, "") {
+		return
+	}
+
+	approval, err = h.bulk.Reject(r.Context(), id, userID, req.Comment)
+	if err != nil {
+		respondWithHostBulkError(w, err, "Failed to reject bulk action")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, approval)
+}
+
+// decodeHostBulkReview reads the optional body of a review
+func decodeHostBulkReview(w http.ResponseWriter, r *http.Request, req *model.HostBulkReviewRequest) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return false
+	}
+	return true
+}
+
+// respondWithHostBulkError sends the status of a bulk host action error
+func respondWithHostBulkError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidHostBulk):
+		respondWithError(w, http.StatusBadRequest, "INVALID_BULK_ACTION", err.Error())
+	case errors.Is(err, service.ErrHostBulkApprovalNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Approval not found")
+	case errors.Is(err, service.ErrHostBulkApprovalClosed):
+		respondWithError(w, http.StatusConflict, "APPROVAL_CLOSED", err.Error())
+	case errors.Is(err, service.ErrHostBulkSelfApproval):
+		respondWithError(w, http.StatusForbidden, "SELF_APPROVAL", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
@@ -0,0 +1,171 @@
+// Package handler provides HTTP handlers for the lifecycle of hosts
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// HostLifecycleHandler handles the lifecycle states of hosts, their agent tokens
+// and the archives decommissioned hosts leave
+type HostLifecycleHandler struct {
+	db        *gorm.DB
+	lifecycle *service.HostLifecycleService
+	reports   *service.AgentReportService
+}
+
+// NewHostLifecycleHandler creates a new host lifecycle handler
+func NewHostLifecycleHandler(db *gorm.DB, lifecycle *service.HostLifecycleService, reports *service.AgentReportService) *HostLifecycleHandler {
+	return &HostLifecycleHandler{db: db, lifecycle: lifecycle, reports: reports}
+}
+
+// GetLifecycle returns the host's lifecycle state, the states it can move to
+// and its transitions (GET /api/v1/hosts/{id}/lifecycle)
+func (h *HostLifecycleHandler) GetLifecycle(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	hostID, ok := pathUUID(w, r, 3, "host")
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "get", &hostID, "host") {
+		return
+	}
+
+	lifecycle, err := h.lifecycle.Get(r.Context(), hostID)
+	if err != nil {
+		respondWithHostLifecycleError(w, err, "Failed to retrieve host lifecycle")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, lifecycle)
+}
+
+// SetLifecycle moves the host to another lifecycle state, responding with the
+// host (PUT /api/v1/hosts/{id}/lifecycle). Decommissioning needs hosts.delete;
+// other transitions need hosts.update.
+func (h *HostLifecycleHandler) SetLifecycle(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	hostID, ok := pathUUID(w, r, 3, "host")
+	if !ok {
+		return
+	}
+
+	var req model.HostLifecycleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	action := "update"
+	if req.Lifecycle == model.HostLifecycleDecommissioning || req.Lifecycle == model.HostLifecycleRetired {
+		action = "delete"
+	}
+	if !requirePermission(w, h.db, userID, "hosts", action, &hostID, "host") {
+		return
+	}
+
+	host, err := h.lifecycle.Transition(r.Context(), userID, hostID, &req)
+	if err != nil {
+		respondWithHostLifecycleError(w, err, "Failed to change host lifecycle")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, host)
+}
+
+// IssueAgentToken gives the host a new agent token, returned only in this
+// response (POST /api/v1/hosts/{id}/agent-token). Its agent must be configured
+// with it: the previous token and the shared agent token stop working for the host.
+func (h *HostLifecycleHandler) IssueAgentToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	hostID, ok := pathUUID(w, r, 3, "host")
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "update", &hostID, "host") {
+		return
+	}
+
+	token, err := h.reports.IssueAgentToken(r.Context(), hostID)
+	if err != nil {
+		respondWithHostLifecycleError(w, err, "Failed to issue agent token")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, token)
+}
+
+// ListArchives returns a page of the archives of decommissioned hosts, without
+// their history (GET /api/v1/host-archives)
+func (h *HostLifecycleHandler) ListArchives(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "list", nil, "") {
+		return
+	}
+	page, pageSize := pageParams(r)
+
+	archives, total, err := h.lifecycle.ListArchives(r.Context(), page, pageSize)
+	if err != nil {
+		respondWithHostLifecycleError(w, err, "Failed to list host archives")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":       archives,
+		"total":      total,
+		"page":       page,
+		"pageSize":   pageSize,
+		"totalPages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// GetArchive returns the archive of a decommissioned host, which outlives the
+// host (GET /api/v1/host-archives/{hostId})
+func (h *HostLifecycleHandler) GetArchive(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "get", nil, "") {
+		return
+	}
+	hostID, ok := pathUUID(w, r, 3, "host")
+	if !ok {
+		return
+	}
+
+	archive, err := h.lifecycle.GetArchive(r.Context(), hostID)
+	if err != nil {
+		respondWithHostLifecycleError(w, err, "Failed to retrieve host archive")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, archive)
+}
+
+// respondWithHostLifecycleError sends the status of a host lifecycle error
+func respondWithHostLifecycleError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrAgentHostNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Host not found")
+	case errors.Is(err, service.ErrHostArchiveNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Host archive not found")
+	case errors.Is(err, service.ErrInvalidHostLifecycle):
+		respondWithError(w, http.StatusBadRequest, "INVALID_LIFECYCLE", err.Error())
+	case errors.Is(err, service.ErrHostLifecycleConflict):
+		respondWithError(w, http.StatusConflict, "LIFECYCLE_CONFLICT", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
@@ -0,0 +1,108 @@
+// Package handler provides HTTP handlers for systemd service control
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// serviceNamePattern matches valid systemd unit names
+var serviceNamePattern = regexp.MustCompile(`^[a-zA-Z0-9@._:\-]+$`)
+
+// ListServices lists the systemd services on a host
+// (GET /api/v1/hosts/{id}/services)
+func (h *ProcessManagementHandler) ListServices(w http.ResponseWriter, r *http.Request) {
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) != 5 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+
+	host, userID, ok := h.agentHost(w, r, pathParts[3], "services")
+	if !ok {
+		return
+	}
+
+	output, err := h.runOnAgent(r, host, userID, model.AgentCommandServiceList, nil)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "AGENT_COMMAND_FAILED", fmt.Sprintf("Failed to list services: %v", err))
+		return
+	}
+
+	var services []model.ServiceInfo
+	if err := json.Unmarshal([]byte(output), &services); err != nil {
+		respondWithError(w, http.StatusBadGateway, "INVALID_AGENT_RESPONSE", "Agent returned an invalid service list")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"services": services,
+			"count":    len(services),
+		},
+	})
+}
+
+// GetService returns the status of a systemd service
+// (GET /api/v1/hosts/{id}/services/{name})
+func (h *ProcessManagementHandler) GetService(w http.ResponseWriter, r *http.Request) {
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) != 6 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+
+	h.controlService(w, r, pathParts[3], pathParts[5], model.ServiceActionStatus)
+}
+
+// ControlService starts, stops, restarts, enables or disables a systemd service
+// (POST /api/v1/hosts/{id}/services/{name}/{action})
+func (h *ProcessManagementHandler) ControlService(w http.ResponseWriter, r *http.Request) {
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) != 7 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+
+	action := model.ServiceAction(pathParts[6])
+	if !action.IsValid() {
+		respondWithError(w, http.StatusBadRequest, "INVALID_ACTION", fmt.Sprintf("Unsupported service action: %s", action))
+		return
+	}
+
+	h.controlService(w, r, pathParts[3], pathParts[5], action)
+}
+
+// controlService runs a service action through the host's agent and responds with the resulting state
+func (h *ProcessManagementHandler) controlService(w http.ResponseWriter, r *http.Request, hostIDStr, name string, action model.ServiceAction) {
+	if !serviceNamePattern.MatchString(name) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_SERVICE", "Invalid service name")
+		return
+	}
+
+	host, userID, ok := h.agentHost(w, r, hostIDStr, "services")
+	if !ok {
+		return
+	}
+
+	args := map[string]string{"name": name, "action": string(action)}
+	output, err := h.runOnAgent(r, host, userID, model.AgentCommandServiceControl, args)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "SERVICE_ACTION_FAILED", fmt.Sprintf("Failed to %s service %s: %v", action, name, err))
+		return
+	}
+
+	var info model.ServiceInfo
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		respondWithError(w, http.StatusBadGateway, "INVALID_AGENT_RESPONSE", "Agent returned an invalid service status")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": info,
+	})
+}
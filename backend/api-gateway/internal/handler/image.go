@@ -0,0 +1,329 @@
+// Package handler provides HTTP handlers for container images and registries
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// imageResolveTimeout bounds an inventory that looks its images up in registries
+const imageResolveTimeout = 60 * time.Second
+
+// ImageHandler handles the image inventory, registry lookups and the registries
+// images are looked up with
+type ImageHandler struct {
+	db     *gorm.DB
+	images *service.ImageService
+}
+
+// NewImageHandler creates a new image handler
+func NewImageHandler(db *gorm.DB, images *service.ImageService) *ImageHandler {
+	return &ImageHandler{db: db, images: images}
+}
+
+// ListImages lists the images deployments and pods run, grouped by image with the
+// workloads running each and the findings of its reference. ?resolve=true also
+// looks every image up in its registry and requires images.inspect.
+func (h *ImageHandler) ListImages(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	req, ok := h.inventoryRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), imageResolveTimeout)
+	defer cancel()
+	inventory, err := h.images.Inventory(ctx, userID, req)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list images")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": inventory,
+	})
+}
+
+// ListFindings lists the workload containers running :latest or an image without a
+// digest, and with ?resolve=true those whose tag moved to another digest
+func (h *ImageHandler) ListFindings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	req, ok := h.inventoryRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), imageResolveTimeout)
+	defer cancel()
+	findings, inventory, err := h.images.Findings(ctx, userID, req)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list image findings")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":      findings,
+		"total":     len(findings),
+		"truncated": inventory.Truncated,
+		"clusters":  inventory.Clusters,
+		"failed":    inventory.Failed,
+	})
+}
+
+// inventoryRequest reads ?clusterIds (comma-separated), ?namespace and ?resolve
+func (h *ImageHandler) inventoryRequest(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (*model.ImageInventoryRequest, bool) {
+	query := r.URL.Query()
+	req := &model.ImageInventoryRequest{
+		Namespace: query.Get("namespace"),
+		Resolve:   query.Get("resolve") == "true",
+	}
+	for _, value := range strings.Split(query.Get("clusterIds"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_CLUSTER_ID", "Invalid cluster ID")
+			return nil, false
+		}
+		req.ClusterIDs = append(req.ClusterIDs, id)
+	}
+	if req.Resolve && !requirePermission(w, h.db, userID, "images", "inspect", nil, "") {
+		return nil, false
+	}
+	return req, true
+}
+
+// InspectImage looks ?image up in its registry: digest, size, labels and platforms
+func (h *ImageHandler) InspectImage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "images", "inspect", nil, "") {
+		return
+	}
+	image := r.URL.Query().Get("image")
+	if image == "" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "image is required")
+		return
+	}
+
+	detail, err := h.images.Inspect(r.Context(), image)
+	if err != nil {
+		respondWithImageError(w, err, "Failed to inspect image")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": detail,
+	})
+}
+
+// ListTags lists the tags of the repository of ?image
+func (h *ImageHandler) ListTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "images", "inspect", nil, "") {
+		return
+	}
+	image := r.URL.Query().Get("image")
+	if image == "" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "image is required")
+		return
+	}
+
+	tags, err := h.images.Tags(r.Context(), image)
+	if err != nil {
+		respondWithImageError(w, err, "Failed to list image tags")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": tags,
+	})
+}
+
+// ListRegistries lists the registries images are looked up with
+func (h *ImageHandler) ListRegistries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "view", nil, "") {
+		return
+	}
+
+	registries, err := h.images.ListRegistries()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch container registries")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  registries,
+		"total": len(registries),
+	})
+}
+
+// CreateRegistry adds credentials for a registry
+func (h *ImageHandler) CreateRegistry(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "manage", nil, "") {
+		return
+	}
+
+	var req model.CreateContainerRegistryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	registry, err := h.images.CreateRegistry(userID, &req)
+	if err != nil {
+		respondWithImageError(w, err, "Failed to create container registry")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, registry)
+}
+
+// GetRegistry gets a registry
+func (h *ImageHandler) GetRegistry(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "view", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "container registry")
+	if !ok {
+		return
+	}
+
+	registry, err := h.images.GetRegistry(id)
+	if err != nil {
+		respondWithImageError(w, err, "Failed to fetch container registry")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, registry)
+}
+
+// UpdateRegistry changes a registry
+func (h *ImageHandler) UpdateRegistry(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "container registry")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateContainerRegistryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	registry, err := h.images.UpdateRegistry(id, &req)
+	if err != nil {
+		respondWithImageError(w, err, "Failed to update container registry")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, registry)
+}
+
+// DeleteRegistry removes a registry's credentials
+func (h *ImageHandler) DeleteRegistry(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "container registry")
+	if !ok {
+		return
+	}
+
+	if err := h.images.DeleteRegistry(id); err != nil {
+		respondWithImageError(w, err, "Failed to delete container registry")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Container registry deleted successfully",
+	})
+}
+
+// TestRegistry authenticates to a registry with its credentials
+func (h *ImageHandler) TestRegistry(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "container registry")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+	start := time.Now()
+	err := h.images.TestRegistry(ctx, id)
+	if errors.Is(err, service.ErrContainerRegistryNotFound) {
+		respondWithImageError(w, err, "Failed to test container registry")
+		return
+	}
+
+	result := map[string]interface{}{
+		"success":      err == nil,
+		"responseTime": time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result["message"] = err.Error()
+	} else {
+		result["message"] = "Registry accepted the credentials"
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// respondWithImageError maps image service errors to responses
+func respondWithImageError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidImage), errors.Is(err, service.ErrInvalidContainerRegistry):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrImageNotFound):
+		respondWithError(w, http.StatusNotFound, "IMAGE_NOT_FOUND", err.Error())
+	case errors.Is(err, service.ErrContainerRegistryNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Container registry not found")
+	case errors.Is(err, service.ErrRegistryUnauthorized):
+		respondWithError(w, http.StatusBadGateway, "REGISTRY_UNAUTHORIZED", err.Error())
+	case errors.Is(err, service.ErrRegistryUnavailable):
+		respondWithError(w, http.StatusBadGateway, "REGISTRY_UNAVAILABLE", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
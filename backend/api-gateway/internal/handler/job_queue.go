@@ -0,0 +1,183 @@
+// Package handler provides HTTP handlers for the background job queue
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// JobQueueHandler lets administrators inspect the job queue, its metrics and
+// its dead letters, and requeue dead jobs
+type JobQueueHandler struct {
+	db   *gorm.DB
+	jobs *service.JobQueue
+}
+
+// NewJobQueueHandler creates a new job queue handler
+func NewJobQueueHandler(db *gorm.DB, jobs *service.JobQueue) *JobQueueHandler {
+	return &JobQueueHandler{db: db, jobs: jobs}
+}
+
+// ListJobs lists jobs, most recently updated first, optionally only those of
+// ?type or ?status; ?status=dead lists the dead letters (GET /api/v1/jobs)
+func (h *JobQueueHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "view", nil, "") {
+		return
+	}
+
+	filter := model.JobFilter{
+		Type:   r.URL.Query().Get("type"),
+		Status: model.JobStatus(r.URL.Query().Get("status")),
+	}
+	page, pageSize := pageParams(r)
+	jobs, total, err := h.jobs.List(filter, page, pageSize)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list jobs")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":     jobs,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// GetJobStats returns the metrics of each job type (GET /api/v1/jobs/stats)
+func (h *JobQueueHandler) GetJobStats(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "view", nil, "") {
+		return
+	}
+
+	stats, err := h.jobs.Stats()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to load job metrics")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": stats,
+	})
+}
+
+// GetJob returns a job (GET /api/v1/jobs/{id})
+func (h *JobQueueHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "view", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "job")
+	if !ok {
+		return
+	}
+
+	job, err := h.jobs.Get(id)
+	if err != nil {
+		respondWithJobError(w, err, "Failed to fetch job")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// RequeueJob queues a dead job to run again with a fresh set of attempts
+// (POST /api/v1/jobs/{id}/requeue)
+func (h *JobQueueHandler) RequeueJob(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "job")
+	if !ok {
+		return
+	}
+
+	job, err := h.jobs.Requeue(id)
+	if err != nil {
+		respondWithJobError(w, err, "Failed to requeue job")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// RequeueDeadJobs queues every dead job of a type, or every dead job when no
+// type is given (POST /api/v1/jobs/requeue)
+func (h *JobQueueHandler) RequeueDeadJobs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "manage", nil, "") {
+		return
+	}
+
+	var req model.RequeueJobsRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+			return
+		}
+	}
+
+	requeued, err := h.jobs.RequeueDead(req.Type)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to requeue jobs")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"requeued": requeued,
+	})
+}
+
+// DeleteJob deletes a job that is not running (DELETE /api/v1/jobs/{id})
+func (h *JobQueueHandler) DeleteJob(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "job")
+	if !ok {
+		return
+	}
+
+	if err := h.jobs.Delete(id); err != nil {
+		respondWithJobError(w, err, "Failed to delete job")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Job deleted",
+	})
+}
+
+func respondWithJobError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrJobNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Job not found")
+	case errors.Is(err, service.ErrJobNotDead):
+		respondWithError(w, http.StatusConflict, "JOB_NOT_DEAD", "Only dead jobs can be requeued")
+	case errors.Is(err, service.ErrJobRunning):
+		respondWithError(w, http.StatusConflict, "JOB_RUNNING", "Job is running")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
@@ -42,6 +42,8 @@ func (h *LDAPLoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			statusCode := http.StatusUnauthorized
 			if appErr.Code == "LDAP_NOT_CONFIGURED" {
 				statusCode = http.StatusServiceUnavailable
+			} else if appErr.Code == "USER_DISABLED" {
+				statusCode = http.StatusForbidden
 			}
 			respondWithError(w, statusCode, appErr.Code, appErr.Message)
 		} else {
@@ -53,6 +55,6 @@ func (h *LDAPLoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"data":      resp,
-		"requestId": generateRequestID(),
+		"requestId": responseRequestID(w),
 	})
 }
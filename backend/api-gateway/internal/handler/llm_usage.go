@@ -0,0 +1,63 @@
+// Package handler provides HTTP handlers for LLM usage reports
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// GetLLMUsage reports LLM tokens and cost by model and conversation for a month.
+// The caller's own usage is reported unless the userId or org query parameter
+// names another user or a department, which needs users.list. The month query
+// parameter is YYYY-MM and defaults to the current month.
+func (h *AIAnalysisHandler) GetLLMUsage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if h.usage == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "LLM usage reporting is not available")
+		return
+	}
+
+	query := r.URL.Query()
+	scope, subject := model.QuotaScopeUser, userID.String()
+	if org := query.Get("org"); org != "" {
+		scope, subject = model.QuotaScopeOrg, org
+	} else if raw := query.Get("userId"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid user ID")
+			return
+		}
+		subject = id.String()
+	}
+	if subject != userID.String() && !requirePermission(w, h.db, userID, "users", "list", nil, "") {
+		return
+	}
+
+	month := time.Now()
+	if raw := query.Get("month"); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01", raw, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "month must be YYYY-MM")
+			return
+		}
+		month = parsed
+	}
+
+	report, err := h.usage.Report(scope, subject, month)
+	if errors.Is(err, service.ErrInvalidQuota) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to report LLM usage")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
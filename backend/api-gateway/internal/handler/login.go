@@ -42,6 +42,10 @@ func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			statusCode := http.StatusBadRequest
 			if appErr.Code == "INVALID_CREDENTIALS" {
 				statusCode = http.StatusUnauthorized
+			} else if appErr.Code == "USER_DISABLED" {
+				statusCode = http.StatusForbidden
+			} else if appErr.Code == "ACCOUNT_LOCKED" {
+				statusCode = http.StatusLocked
 			}
 			respondWithError(w, statusCode, appErr.Code, appErr.Message)
 		} else {
@@ -53,6 +57,6 @@ func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"data":      resp,
-		"requestId": generateRequestID(),
+		"requestId": responseRequestID(w),
 	})
 }
@@ -0,0 +1,311 @@
+// Package handler provides HTTP handlers for log backends
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// logQueryTimeout bounds requests made to log backends
+const logQueryTimeout = 30 * time.Second
+
+// LogHandler handles log data source and log query operations
+type LogHandler struct {
+	db   *gorm.DB
+	logs *service.LogService
+}
+
+// NewLogHandler creates a new log handler
+func NewLogHandler(db *gorm.DB) *LogHandler {
+	return &LogHandler{db: db, logs: service.NewLogService(db)}
+}
+
+// ============== Data Source Management ==============
+
+// CreateDataSource creates a new Loki data source
+func (h *LogHandler) CreateDataSource(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateLogDataSourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if req.Name == "" || req.URL == "" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "name and url are required")
+		return
+	}
+	if !req.Type.IsValid() {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "type must be loki")
+		return
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "url must be an http or https URL")
+		return
+	}
+
+	// Verify cluster ownership if provided
+	if req.ClusterID != nil {
+		var cluster model.K8sCluster
+		if err := h.db.Where("id = ? AND user_id = ?", req.ClusterID, userID).First(&cluster).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch cluster")
+			}
+			return
+		}
+	}
+
+	var existing model.LogDataSource
+	if err := h.db.Where("user_id = ? AND name = ?", userID, req.Name).First(&existing).Error; err == nil {
+		respondWithError(w, http.StatusConflict, "CONFLICT", "Data source name already exists")
+		return
+	}
+	if !enforceQuota(w, userID, model.QuotaResourceDataSources, 1) {
+		return
+	}
+
+	dataSource := model.LogDataSource{
+		UserID:          userID,
+		ClusterID:       req.ClusterID,
+		Name:            req.Name,
+		Type:            req.Type,
+		URL:             req.URL,
+		Username:        req.Username,
+		Password:        req.Password,
+		Token:           req.Token,
+		TenantID:        req.TenantID,
+		Status:          model.DSStatusActive,
+		InsecureSkipTLS: req.InsecureSkipTLS,
+		Headers:         req.Headers,
+	}
+	if err := h.db.Create(&dataSource).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create data source")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, dataSource)
+}
+
+// ListDataSources lists the user's log data sources
+func (h *LogHandler) ListDataSources(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	query := h.db.Model(&model.LogDataSource{}).Where("user_id = ?", userID)
+	if clusterID, err := uuid.Parse(r.URL.Query().Get("clusterId")); err == nil {
+		query = query.Where("cluster_id = ?", clusterID)
+	}
+	if dsType := r.URL.Query().Get("type"); dsType != "" {
+		query = query.Where("type = ?", dsType)
+	}
+
+	var dataSources []model.LogDataSource
+	if err := query.Preload("Cluster").Order("created_at DESC").Find(&dataSources).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch data sources")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  dataSources,
+		"total": len(dataSources),
+	})
+}
+
+// GetDataSource gets a log data source
+func (h *LogHandler) GetDataSource(w http.ResponseWriter, r *http.Request) {
+	dataSource, ok := h.ownedDataSource(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, dataSource)
+}
+
+// UpdateDataSource updates a log data source
+func (h *LogHandler) UpdateDataSource(w http.ResponseWriter, r *http.Request) {
+	dataSource, ok := h.ownedDataSource(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.UpdateLogDataSourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.URL != nil {
+		updates["url"] = *req.URL
+	}
+	if req.Username != nil {
+		updates["username"] = *req.Username
+	}
+	if req.Password != nil {
+		updates["password"] = *req.Password
+	}
+	if req.Token != nil {
+		updates["token"] = *req.Token
+	}
+	if req.TenantID != nil {
+		updates["tenant_id"] = *req.TenantID
+	}
+	if req.InsecureSkipTLS != nil {
+		updates["insecure_skip_tls"] = *req.InsecureSkipTLS
+	}
+	if req.Headers != nil {
+		updates["headers"] = *req.Headers
+	}
+	if req.Status != nil {
+		updates["status"] = *req.Status
+	}
+
+	if err := h.db.Model(dataSource).Updates(updates).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update data source")
+		return
+	}
+
+	h.db.Preload("Cluster").First(dataSource, dataSource.ID)
+	respondWithJSON(w, http.StatusOK, dataSource)
+}
+
+// DeleteDataSource deletes a log data source
+func (h *LogHandler) DeleteDataSource(w http.ResponseWriter, r *http.Request) {
+	dataSource, ok := h.ownedDataSource(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(dataSource).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete data source")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Data source deleted successfully",
+	})
+}
+
+// TestDataSource checks that a log data source is reachable
+func (h *LogHandler) TestDataSource(w http.ResponseWriter, r *http.Request) {
+	dataSource, ok := h.ownedDataSource(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), logQueryTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := h.logs.Test(ctx, dataSource)
+	response := map[string]interface{}{
+		"success":  err == nil,
+		"duration": time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// ============== Log Queries ==============
+
+// QueryLogs runs a LogQL query.
+// Query parameters: query, start, end (RFC 3339 or unix seconds), limit.
+func (h *LogHandler) QueryLogs(w http.ResponseWriter, r *http.Request) {
+	dataSource, ok := h.ownedDataSource(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	query := params.Get("query")
+	if query == "" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "query is required")
+		return
+	}
+
+	start, err := parseQueryTime(params.Get("start"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid start time")
+		return
+	}
+	end, err := parseQueryTime(params.Get("end"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid end time")
+		return
+	}
+	limit := 0
+	if limitStr := params.Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > service.MaxLogQueryLimit {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "limit must be between 1 and 5000")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), logQueryTimeout)
+	defer cancel()
+
+	entries, err := h.logs.Query(ctx, dataSource, query, start, end, limit)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "LOG_BACKEND_ERROR", err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  entries,
+		"total": len(entries),
+	})
+}
+
+// ownedDataSource resolves the data source in the URL path and checks that the user owns it
+func (h *LogHandler) ownedDataSource(w http.ResponseWriter, r *http.Request) (*model.LogDataSource, bool) {
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) < 5 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return nil, false
+	}
+
+	dataSourceID, err := uuid.Parse(pathParts[4])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID format")
+		return nil, false
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	var dataSource model.LogDataSource
+	if err := h.db.Preload("Cluster").Where("id = ? AND user_id = ?", dataSourceID, userID).First(&dataSource).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Data source not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch data source")
+		}
+		return nil, false
+	}
+
+	return &dataSource, true
+}
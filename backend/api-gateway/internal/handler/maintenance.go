@@ -0,0 +1,109 @@
+// Package handler provides HTTP handlers for maintenance windows
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// MaintenanceHandler handles maintenance window operations
+type MaintenanceHandler struct {
+	db          *gorm.DB
+	maintenance *service.MaintenanceService
+}
+
+// NewMaintenanceHandler creates a new maintenance handler
+func NewMaintenanceHandler(db *gorm.DB, maintenance *service.MaintenanceService) *MaintenanceHandler {
+	return &MaintenanceHandler{db: db, maintenance: maintenance}
+}
+
+// CreateMaintenanceWindow creates a maintenance window
+func (h *MaintenanceHandler) CreateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateMaintenanceWindowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	username, _ := r.Context().Value("username").(string)
+	window, err := h.maintenance.Create(userID, username, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidMaintenanceWindow) {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create maintenance window")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, window.Response(window.CreatedAt))
+}
+
+// ListMaintenanceWindows lists maintenance windows, optionally filtered by status
+func (h *MaintenanceHandler) ListMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", model.MaintenanceStatusScheduled, model.MaintenanceStatusActive, model.MaintenanceStatusExpired:
+	default:
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "status must be scheduled, active or expired")
+		return
+	}
+
+	windows, err := h.maintenance.List(userID, status)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list maintenance windows")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"windows": windows,
+		"total":   len(windows),
+	})
+}
+
+// ExpireMaintenanceWindow ends a maintenance window immediately
+func (h *MaintenanceHandler) ExpireMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	parts := splitPath(r.URL.Path)
+	if len(parts) != 5 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+	windowID, err := uuid.Parse(parts[3])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid maintenance window ID format")
+		return
+	}
+
+	window, err := h.maintenance.Expire(userID, windowID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Maintenance window not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to expire maintenance window")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, window.Response(*window.ExpiredAt))
+}
@@ -0,0 +1,130 @@
+// Package handler provides HTTP handlers for namespace bindings
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// NamespaceBindingHandler handles granting users access to cluster namespaces
+type NamespaceBindingHandler struct {
+	db       *gorm.DB
+	bindings *service.NamespaceBindingService
+}
+
+// NewNamespaceBindingHandler creates a new namespace binding handler
+func NewNamespaceBindingHandler(db *gorm.DB, bindings *service.NamespaceBindingService) *NamespaceBindingHandler {
+	return &NamespaceBindingHandler{db: db, bindings: bindings}
+}
+
+// ListBindings lists namespace bindings, filtered by the userId and clusterId query parameters
+func (h *NamespaceBindingHandler) ListBindings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "roles", "list", nil, "") {
+		return
+	}
+
+	filterUser, ok := optionalUUIDParam(w, r, "userId")
+	if !ok {
+		return
+	}
+	filterCluster, ok := optionalUUIDParam(w, r, "clusterId")
+	if !ok {
+		return
+	}
+
+	bindings, err := h.bindings.List(filterUser, filterCluster)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list namespace bindings")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  bindings,
+		"total": len(bindings),
+	})
+}
+
+// CreateBinding grants a user a role in a cluster namespace
+func (h *NamespaceBindingHandler) CreateBinding(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "roles", "manage", nil, "") {
+		return
+	}
+
+	var req model.CreateNamespaceBindingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	binding, err := h.bindings.Grant(&req, userID)
+	if errors.Is(err, service.ErrInvalidNamespaceBinding) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to grant namespace access")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, binding)
+}
+
+// DeleteBinding revokes a namespace binding
+func (h *NamespaceBindingHandler) DeleteBinding(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "roles", "manage", nil, "") {
+		return
+	}
+
+	// /api/v1/namespace-bindings/{id}
+	parts := splitPath(r.URL.Path)
+	if len(parts) < 4 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+	id, err := uuid.Parse(parts[3])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid binding ID")
+		return
+	}
+
+	if err := h.bindings.Revoke(id); errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Namespace binding not found")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to revoke namespace binding")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Namespace binding revoked successfully",
+	})
+}
+
+// optionalUUIDParam parses an optional UUID query parameter, sending a 400 response
+// if it is malformed
+func optionalUUIDParam(w http.ResponseWriter, r *http.Request, name string) (*uuid.UUID, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, true
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid "+name)
+		return nil, false
+	}
+	return &id, true
+}
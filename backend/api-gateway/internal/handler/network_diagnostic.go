@@ -0,0 +1,155 @@
+// Package handler provides HTTP handlers for network diagnostics run by host agents
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// NetworkDiagnosticHandler handles DNS, traceroute, TCP connect and bandwidth
+// tests run from host agents
+type NetworkDiagnosticHandler struct {
+	db          *gorm.DB
+	diagnostics *service.NetworkDiagnosticService
+	flags       *service.FeatureFlagService
+}
+
+// NewNetworkDiagnosticHandler creates a new network diagnostic handler
+func NewNetworkDiagnosticHandler(db *gorm.DB, diagnostics *service.NetworkDiagnosticService, flags *service.FeatureFlagService) *NetworkDiagnosticHandler {
+	return &NetworkDiagnosticHandler{db: db, diagnostics: diagnostics, flags: flags}
+}
+
+// ListDiagnostics lists the diagnostic history, newest first, optionally of a
+// host, type, status or target (GET /api/v1/diagnostics)
+func (h *NetworkDiagnosticHandler) ListDiagnostics(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "diagnostics", nil, "") {
+		return
+	}
+
+	query := r.URL.Query()
+	page, pageSize := pageParams(r)
+	filter := &model.NetworkDiagnosticFilter{
+		HostID:   queryUUID(r, "hostId"),
+		Type:     model.NetworkDiagnosticType(query.Get("type")),
+		Status:   model.NetworkDiagnosticStatus(query.Get("status")),
+		Search:   query.Get("search"),
+		Page:     page,
+		PageSize: pageSize,
+	}
+
+	diagnostics, total, err := h.diagnostics.List(filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch diagnostics")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":     diagnostics,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// RunDiagnostic starts a test from a host's agent and answers 202 Accepted with
+// the operation running it (POST /api/v1/diagnostics)
+func (h *NetworkDiagnosticHandler) RunDiagnostic(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requireFeature(w, h.flags, userID, model.FeatureAgentCommands) {
+		return
+	}
+
+	var req model.RunNetworkDiagnosticRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "diagnostics", &req.HostID, "host") {
+		return
+	}
+	// A bandwidth test also runs a server on its peer
+	if req.Type == model.NetworkDiagnosticBandwidth && req.PeerHostID != nil &&
+		!requirePermission(w, h.db, userID, "hosts", "diagnostics", req.PeerHostID, "host") {
+		return
+	}
+
+	operation, err := h.diagnostics.Start(userID, &req)
+	if err != nil {
+		respondWithDiagnosticError(w, err, "Failed to start diagnostic")
+		return
+	}
+	respondAccepted(w, operation)
+}
+
+// GetDiagnostic gets a diagnostic with its result (GET /api/v1/diagnostics/{id})
+func (h *NetworkDiagnosticHandler) GetDiagnostic(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "diagnostics", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "diagnostic")
+	if !ok {
+		return
+	}
+
+	diagnostic, err := h.diagnostics.Get(id)
+	if err != nil {
+		respondWithDiagnosticError(w, err, "Failed to fetch diagnostic")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, diagnostic)
+}
+
+// DeleteDiagnostic deletes a finished diagnostic from the history
+// (DELETE /api/v1/diagnostics/{id})
+func (h *NetworkDiagnosticHandler) DeleteDiagnostic(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "hosts", "diagnostics", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "diagnostic")
+	if !ok {
+		return
+	}
+
+	if err := h.diagnostics.Delete(id); err != nil {
+		respondWithDiagnosticError(w, err, "Failed to delete diagnostic")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Diagnostic deleted successfully",
+	})
+}
+
+// respondWithDiagnosticError maps network diagnostic service errors to responses
+func respondWithDiagnosticError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidNetworkDiagnostic):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrNetworkDiagnosticNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Diagnostic not found")
+	case errors.Is(err, service.ErrDiagnosticHostNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Host not found")
+	case errors.Is(err, service.ErrDiagnosticHostUnavailable):
+		respondWithError(w, http.StatusServiceUnavailable, "AGENT_UNAVAILABLE", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
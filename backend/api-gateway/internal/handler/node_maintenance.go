@@ -0,0 +1,119 @@
+// Package handler provides HTTP handlers for node maintenance
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// NodeMaintenanceHandler handles cordoning, uncordoning and draining cluster nodes
+type NodeMaintenanceHandler struct {
+	db          *gorm.DB
+	maintenance *service.NodeMaintenanceService
+}
+
+// NewNodeMaintenanceHandler creates a new node maintenance handler
+func NewNodeMaintenanceHandler(db *gorm.DB, maintenance *service.NodeMaintenanceService) *NodeMaintenanceHandler {
+	return &NodeMaintenanceHandler{db: db, maintenance: maintenance}
+}
+
+// CordonNode marks a node unschedulable (POST /api/v1/clusters/{id}/nodes/{name}/cordon)
+func (h *NodeMaintenanceHandler) CordonNode(w http.ResponseWriter, r *http.Request) {
+	_, clusterID, node, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	if err := h.maintenance.Cordon(r.Context(), clusterID, node); err != nil {
+		respondWithNodeMaintenanceError(w, err, "Failed to cordon node")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Node cordoned successfully",
+	})
+}
+
+// UncordonNode makes a node schedulable again (POST /api/v1/clusters/{id}/nodes/{name}/uncordon)
+func (h *NodeMaintenanceHandler) UncordonNode(w http.ResponseWriter, r *http.Request) {
+	_, clusterID, node, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	if err := h.maintenance.Uncordon(r.Context(), clusterID, node); err != nil {
+		respondWithNodeMaintenanceError(w, err, "Failed to uncordon node")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Node uncordoned successfully",
+	})
+}
+
+// DrainNode starts draining a node and returns the operation to poll
+// (POST /api/v1/clusters/{id}/nodes/{name}/drain)
+func (h *NodeMaintenanceHandler) DrainNode(w http.ResponseWriter, r *http.Request) {
+	userID, clusterID, node, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.DrainNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	operation, err := h.maintenance.Drain(userID, clusterID, node, &req)
+	if err != nil {
+		respondWithNodeMaintenanceError(w, err, "Failed to start drain")
+		return
+	}
+	respondAccepted(w, operation)
+}
+
+// authorize checks the user owns the cluster or holds nodes.maintain on it, and
+// returns the user and the cluster and node of the path
+func (h *NodeMaintenanceHandler) authorize(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, string, bool) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, "", false
+	}
+	clusterID, ok := pathUUID(w, r, 3, "cluster")
+	if !ok {
+		return uuid.Nil, uuid.Nil, "", false
+	}
+	parts := splitPath(r.URL.Path)
+	if len(parts) < 6 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return uuid.Nil, uuid.Nil, "", false
+	}
+
+	var cluster model.K8sCluster
+	if err := h.db.Select("id", "user_id").Where("id = ?", clusterID).First(&cluster).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+		return uuid.Nil, uuid.Nil, "", false
+	}
+	if cluster.UserID != userID && !requirePermission(w, h.db, userID, "nodes", "maintain", &clusterID, "cluster") {
+		return uuid.Nil, uuid.Nil, "", false
+	}
+	return userID, clusterID, parts[5], true
+}
+
+// respondWithNodeMaintenanceError maps node maintenance service errors to responses
+func respondWithNodeMaintenanceError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidNodeMaintenance):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrNodeClusterNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	case errors.Is(err, service.ErrNodeMaintenanceFailed):
+		respondWithError(w, http.StatusBadGateway, "CLUSTER_ERROR", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
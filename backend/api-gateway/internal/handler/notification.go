@@ -3,9 +3,11 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/wangjialin/myops/api-gateway/internal/service"
@@ -30,6 +32,11 @@ func NewNotificationHandler(db *gorm.DB, logger *zap.Logger) *NotificationHandle
 	}
 }
 
+// SetEventBus sets the bus read state changes are published on
+func (h *NotificationHandler) SetEventBus(events *service.EventBus) {
+	h.notificationService.SetEventBus(events)
+}
+
 // GetNotifications handles notification list retrieval
 func (h *NotificationHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
@@ -132,7 +139,7 @@ func (h *NotificationHandler) MarkAsRead(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = h.notificationService.MarkAsRead(id)
+	_, err = h.notificationService.UpdateNotifications(userID, model.NotificationActionRead, []uuid.UUID{id})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to mark notification as read")
 		return
@@ -173,6 +180,92 @@ func (h *NotificationHandler) MarkAllAsRead(w http.ResponseWriter, r *http.Reque
 	})
 }
 
+// SearchNotifications handles cursor-paged notification search for infinite
+// scroll. Sources, types and priorities are comma-separated.
+func (h *NotificationHandler) SearchNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	filter := model.NotificationFilter{
+		Search:   params.Get("q"),
+		Archived: params.Get("archived") == "true",
+		Cursor:   params.Get("cursor"),
+	}
+	filter.Limit, _ = strconv.Atoi(params.Get("limit"))
+	for _, v := range splitNotificationParam(params.Get("sources")) {
+		filter.Sources = append(filter.Sources, model.NotificationSource(v))
+	}
+	for _, v := range splitNotificationParam(params.Get("types")) {
+		filter.Types = append(filter.Types, model.NotificationType(v))
+	}
+	for _, v := range splitNotificationParam(params.Get("priorities")) {
+		filter.Priorities = append(filter.Priorities, model.NotificationPriority(v))
+	}
+	if v := params.Get("read"); v != "" {
+		read, err := strconv.ParseBool(v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "read must be true or false")
+			return
+		}
+		filter.Read = &read
+	}
+
+	page, err := h.notificationService.SearchNotifications(userID, &filter)
+	if errors.Is(err, service.ErrInvalidNotificationRequest) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to search notifications")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+// splitNotificationParam splits a comma-separated query parameter
+func splitNotificationParam(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// BulkUpdateNotifications handles marking notifications read or unread,
+// archiving, restoring and deleting them in one request
+func (h *NotificationHandler) BulkUpdateNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.NotificationBulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	affected, err := h.notificationService.UpdateNotifications(userID, req.Action, req.IDs)
+	if errors.Is(err, service.ErrInvalidNotificationRequest) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update notifications")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"affected": affected,
+	})
+}
+
 // DeleteNotification handles notification deletion
 func (h *NotificationHandler) DeleteNotification(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
@@ -210,7 +303,7 @@ func (h *NotificationHandler) DeleteNotification(w http.ResponseWriter, r *http.
 		return
 	}
 
-	err = h.notificationService.DeleteNotification(id)
+	_, err = h.notificationService.UpdateNotifications(userID, model.NotificationActionDelete, []uuid.UUID{id})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete notification")
 		return
@@ -264,8 +357,13 @@ func (h *NotificationHandler) UpdateNotificationPreference(w http.ResponseWriter
 		return
 	}
 
-	var pref model.NotificationPreference
-	if err := json.NewDecoder(r.Body).Decode(&pref); err != nil {
+	// Fields left out of the body keep their current values
+	pref, err := h.notificationService.GetNotificationPreference(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve notification preferences")
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(pref); err != nil {
 		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
 		return
 	}
@@ -273,7 +371,11 @@ func (h *NotificationHandler) UpdateNotificationPreference(w http.ResponseWriter
 	// Ensure user ID matches
 	pref.UserID = userID
 
-	err := h.notificationService.UpdateNotificationPreference(&pref)
+	err = h.notificationService.UpdateNotificationPreference(pref)
+	if errors.Is(err, service.ErrInvalidNotificationPreference) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update notification preferences")
 		return
@@ -284,6 +386,48 @@ func (h *NotificationHandler) UpdateNotificationPreference(w http.ResponseWriter
 	})
 }
 
+// PreviewNotificationPreference shows what the preferences in the body, or the
+// current ones, would have delivered at once, digested or held for quiet hours
+// among the user's notifications of the last day
+func (h *NotificationHandler) PreviewNotificationPreference(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	var userID uuid.UUID
+	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
+		if uid, ok := userIDVal.(string); ok {
+			userID, _ = uuid.Parse(uid)
+		}
+	}
+
+	if userID == (uuid.UUID{}) {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return
+	}
+
+	pref, err := h.notificationService.GetNotificationPreference(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve notification preferences")
+		return
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(pref); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+			return
+		}
+	}
+
+	preview, err := h.notificationService.PreviewNotificationPreference(userID, pref, time.Now())
+	if errors.Is(err, service.ErrInvalidNotificationPreference) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to preview notification preferences")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, preview)
+}
+
 // GetNotificationStats handles notification statistics retrieval
 func (h *NotificationHandler) GetNotificationStats(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
@@ -318,6 +462,7 @@ func (h *NotificationHandler) CreateNotification(w http.ResponseWriter, r *http.
 		Title    string                   `json:"title"`
 		Message  string                   `json:"message"`
 		Priority model.NotificationPriority `json:"priority"`
+		Source   model.NotificationSource   `json:"source"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -331,8 +476,13 @@ func (h *NotificationHandler) CreateNotification(w http.ResponseWriter, r *http.
 		return
 	}
 
-	notification, err := h.notificationService.CreateNotification(
+	if req.Source == "" {
+		req.Source = model.NotificationSourceSystem
+	}
+
+	notification, err := h.notificationService.CreateSourcedNotification(
 		userID,
+		req.Source,
 		req.Type,
 		req.Title,
 		req.Message,
@@ -0,0 +1,202 @@
+// Package handler provides HTTP handlers for API Gateway
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	apperrors "github.com/wangjialin/myops/pkg/errors"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// oidcStateCookie carries the login state between the redirect to the identity
+// provider and the callback
+const oidcStateCookie = "myops_oidc"
+
+// OIDCLoginHandler handles login through an OIDC identity provider
+type OIDCLoginHandler struct {
+	AuthService *service.AuthService
+	SSO         *service.SSOService
+	Settings    *service.SettingsService
+}
+
+// NewOIDCLoginHandler creates a new OIDCLoginHandler
+func NewOIDCLoginHandler(authService *service.AuthService, sso *service.SSOService, settings *service.SettingsService) *OIDCLoginHandler {
+	return &OIDCLoginHandler{
+		AuthService: authService,
+		SSO:         sso,
+		Settings:    settings,
+	}
+}
+
+// Login redirects the browser to the identity provider
+func (h *OIDCLoginHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	if !h.SSO.OIDCEnabled() {
+		respondWithError(w, http.StatusServiceUnavailable, "OIDC_NOT_CONFIGURED", "OIDC authentication is not configured")
+		return
+	}
+
+	authURL, state, err := h.SSO.BeginOIDCLogin(r.Context())
+	if err != nil {
+		respondWithOIDCError(w, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    strings.Join([]string{state.State, state.Nonce, state.Verifier}, "."),
+		Path:     "/api/v1/auth/oidc",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback completes a login when the identity provider redirects back. The tokens
+// are handed to the frontend in the URL fragment, which browsers do not send to
+// servers; without a frontend URL they are returned as JSON.
+func (h *OIDCLoginHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	// The state cookie is single use
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/api/v1/auth/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		message := "Identity provider returned " + errCode
+		if desc := query.Get("error_description"); desc != "" {
+			message += ": " + desc
+		}
+		h.finish(w, r, nil, apperrors.NewError("OIDC_AUTH_FAILED", message))
+		return
+	}
+
+	state, ok := oidcLoginState(r)
+	if !ok || subtle.ConstantTimeCompare([]byte(state.State), []byte(query.Get("state"))) != 1 {
+		h.finish(w, r, nil, apperrors.NewError("OIDC_INVALID_STATE", "Login state is missing or does not match; start the login again"))
+		return
+	}
+	code := query.Get("code")
+	if code == "" {
+		h.finish(w, r, nil, apperrors.NewError("OIDC_AUTH_FAILED", "Callback has no authorization code"))
+		return
+	}
+
+	user, displayName, err := h.SSO.CompleteOIDCLogin(r.Context(), code, state)
+	if err != nil {
+		h.finish(w, r, nil, err)
+		return
+	}
+	resp, err := h.AuthService.IssueTokens(r.Context(), user, displayName)
+	h.finish(w, r, resp, err)
+}
+
+// finish sends the login result to the frontend, or as JSON if none is configured
+func (h *OIDCLoginHandler) finish(w http.ResponseWriter, r *http.Request, resp *service.LoginResponse, err error) {
+	frontendURL := h.Settings.String(model.SettingOIDCFrontendURL)
+	if frontendURL == "" {
+		if err != nil {
+			respondWithOIDCError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	fragment := url.Values{}
+	if err != nil {
+		code, message := "INTERNAL_ERROR", "Internal server error"
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			code, message = appErr.Code, appErr.Message
+		}
+		fragment.Set("error", code)
+		fragment.Set("message", message)
+	} else {
+		fragment.Set("accessToken", resp.AccessToken)
+		fragment.Set("refreshToken", resp.RefreshToken)
+		fragment.Set("expiresIn", strconv.Itoa(resp.ExpiresIn))
+	}
+	http.Redirect(w, r, frontendURL+"#"+fragment.Encode(), http.StatusFound)
+}
+
+// oidcLoginState reads the state cookie set by Login
+func oidcLoginState(r *http.Request) (*service.OIDCLoginState, bool) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return nil, false
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, false
+	}
+	return &service.OIDCLoginState{State: parts[0], Nonce: parts[1], Verifier: parts[2]}, true
+}
+
+// isSecureRequest reports whether the browser reached the gateway over HTTPS,
+// directly or through a proxy
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func respondWithOIDCError(w http.ResponseWriter, err error) {
+	appErr, ok := err.(*apperrors.AppError)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
+		return
+	}
+	statusCode := http.StatusUnauthorized
+	switch appErr.Code {
+	case "OIDC_NOT_CONFIGURED", "OIDC_UNAVAILABLE":
+		statusCode = http.StatusServiceUnavailable
+	case "OIDC_INVALID_STATE":
+		statusCode = http.StatusBadRequest
+	case "SSO_ACCOUNT_CONFLICT":
+		statusCode = http.StatusConflict
+	case "USER_DISABLED":
+		statusCode = http.StatusForbidden
+	}
+	respondWithError(w, statusCode, appErr.Code, appErr.Message)
+}
+
+// AuthProvidersHandler lists the login methods offered, so the login page can show
+// the right options
+type AuthProvidersHandler struct {
+	AuthService *service.AuthService
+}
+
+// NewAuthProvidersHandler creates a new AuthProvidersHandler
+func NewAuthProvidersHandler(authService *service.AuthService) *AuthProvidersHandler {
+	return &AuthProvidersHandler{
+		AuthService: authService,
+	}
+}
+
+// ServeHTTP handles HTTP requests for the login methods
+func (h *AuthProvidersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, h.AuthService.Providers())
+}
@@ -0,0 +1,115 @@
+// Package handler provides HTTP handlers for long-running operations
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// OperationHandler handles polling and cancelling long-running operations
+type OperationHandler struct {
+	operations *service.OperationService
+}
+
+// NewOperationHandler creates a new operation handler
+func NewOperationHandler(operations *service.OperationService) *OperationHandler {
+	return &OperationHandler{operations: operations}
+}
+
+// ListOperations lists the user's operations, newest first, optionally only those
+// of ?type, ?status or ?resourceId, or ?active=true ones (GET /api/v1/operations)
+func (h *OperationHandler) ListOperations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := model.OperationFilter{
+		Type:       model.OperationKind(query.Get("type")),
+		Status:     model.OperationStatus(query.Get("status")),
+		ResourceID: queryUUID(r, "resourceId"),
+		Active:     query.Get("active") == "true",
+	}
+	page, pageSize := pageParams(r)
+	operations, total, err := h.operations.List(userID, filter, page, pageSize)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list operations")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":     operations,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// GetOperation returns an operation, polled until its status is done
+// (GET /api/v1/operations/{id})
+func (h *OperationHandler) GetOperation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "operation")
+	if !ok {
+		return
+	}
+
+	operation, err := h.operations.Get(userID, id)
+	if err != nil {
+		respondWithOperationError(w, err, "Failed to fetch operation")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, operation)
+}
+
+// CancelOperation requests that an operation stop (POST /api/v1/operations/{id}/cancel).
+// The operation reports cancelled once its work has stopped.
+func (h *OperationHandler) CancelOperation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "operation")
+	if !ok {
+		return
+	}
+
+	operation, err := h.operations.Cancel(userID, id)
+	if err != nil {
+		respondWithOperationError(w, err, "Failed to cancel operation")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, operation)
+}
+
+// respondAccepted answers a request that started an operation with 202 Accepted,
+// pointing at where the operation is polled
+func respondAccepted(w http.ResponseWriter, operation *model.Operation) {
+	location := "/api/v1/operations/" + operation.ID.String()
+	w.Header().Set("Location", location)
+	respondWithJSON(w, http.StatusAccepted, model.OperationAccepted{
+		OperationID: operation.ID,
+		Status:      operation.Status,
+		Location:    location,
+		Operation:   operation,
+	})
+}
+
+func respondWithOperationError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrOperationNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Operation not found")
+	case errors.Is(err, service.ErrOperationDone):
+		respondWithError(w, http.StatusConflict, "OPERATION_DONE", "Operation already finished")
+	case errors.Is(err, service.ErrOperationNotCancellable):
+		respondWithError(w, http.StatusConflict, "NOT_CANCELLABLE", "Operation cannot be cancelled")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
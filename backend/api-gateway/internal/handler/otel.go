@@ -2,34 +2,92 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
 	"github.com/wangjialin/myops/pkg/model"
 	"gorm.io/gorm"
 )
 
 // OtelHandler handles OpenTelemetry Collector operations
 type OtelHandler struct {
-	db *gorm.DB
+	db         *gorm.DB
+	collectors *service.OtelCollectorService
 }
 
+// collectorOpTimeout bounds collector deployment operations
+const collectorOpTimeout = 90 * time.Second
+
 // NewOtelHandler creates a new Otel handler
-func NewOtelHandler(db *gorm.DB) *OtelHandler {
-	return &OtelHandler{db: db}
+func NewOtelHandler(db *gorm.DB, collectors *service.OtelCollectorService) *OtelHandler {
+	if collectors == nil {
+		collectors = service.NewOtelCollectorService(db, nil)
+	}
+	return &OtelHandler{db: db, collectors: collectors}
 }
 
-// CreateCollector creates a new OpenTelemetry collector deployment
-func (h *OtelHandler) CreateCollector(w http.ResponseWriter, r *http.Request) {
-	var req model.CreateCollectorRequest
+// RenderConfig renders a pipeline spec as collector YAML without saving it
+func (h *OtelHandler) RenderConfig(w http.ResponseWriter, r *http.Request) {
+	var req model.RenderCollectorConfigRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
 		return
 	}
 
+	config, err := service.RenderCollectorConfig(&req.Pipeline)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_CONFIG", err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"config":     config,
+			"configHash": service.ConfigHash(config),
+		},
+	})
+}
+
+// ValidateConfig dry-runs validation of raw collector YAML or a pipeline spec.
+// Invalid configs are reported in the result rather than as an error response.
+func (h *OtelHandler) ValidateConfig(w http.ResponseWriter, r *http.Request) {
+	var req model.ValidateCollectorConfigRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if req.Pipeline == nil && strings.TrimSpace(req.Config) == "" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "config or pipeline is required")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": service.DryRunCollectorConfig(req.Config, req.Pipeline),
+	})
+}
+
+// ValidateCollector dry-runs validation of the config a collector would be deployed with
+func (h *OtelHandler) ValidateCollector(w http.ResponseWriter, r *http.Request) {
+	// Extract collector ID from URL path
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 6 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request")
+		return
+	}
+
+	collectorUUID, err := uuid.Parse(parts[4])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid collector ID format")
+		return
+	}
+
 	// Get user ID from context
 	userIDVal := r.Context().Value("user_id")
 	if userIDVal == nil {
@@ -49,21 +107,97 @@ func (h *OtelHandler) CreateCollector(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify cluster ownership
-	var cluster model.K8sCluster
-	if err := h.db.Where("id = ? AND user_id = ?", req.ClusterID, userUUID).First(&cluster).Error; err != nil {
+	// Fetch collector
+	var collector model.OtelCollector
+	if err := h.db.Where("id = ? AND user_id = ?", collectorUUID, userUUID).First(&collector).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Collector not found")
 		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch cluster")
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch collector")
 		}
 		return
 	}
 
-	// Check if collector name already exists for this cluster/namespace
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": service.DryRunCollector(&collector),
+	})
+}
+
+// CreateCollector creates a new OpenTelemetry collector deployment
+func (h *OtelHandler) CreateCollector(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateCollectorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	// Get user ID from context
+	userIDVal := r.Context().Value("user_id")
+	if userIDVal == nil {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return
+	}
+
+	userID, ok := userIDVal.(string)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
+		return
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = model.CollectorModeDeployment
+	}
+	if !req.Mode.IsValid() {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "mode must be deployment, daemonset or systemd")
+		return
+	}
+
+	existing := h.db.Where("name = ?", req.Name)
+	if req.Mode == model.CollectorModeSystemd {
+		if req.HostID == nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "hostId is required for systemd collectors")
+			return
+		}
+		var host model.Host
+		if err := h.db.Where("id = ?", *req.HostID).First(&host).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Host not found")
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch host")
+			}
+			return
+		}
+		req.ClusterID = nil
+		existing = existing.Where("host_id = ?", *req.HostID)
+	} else {
+		if req.ClusterID == nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "clusterId is required for Kubernetes collectors")
+			return
+		}
+		// Verify cluster ownership
+		var cluster model.K8sCluster
+		if err := h.db.Where("id = ? AND user_id = ?", *req.ClusterID, userUUID).First(&cluster).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch cluster")
+			}
+			return
+		}
+		req.HostID = nil
+		existing = existing.Where("cluster_id = ? AND namespace = ?", *req.ClusterID, req.Namespace)
+	}
+
+	// Check if collector name already exists on this cluster/namespace or host
 	var existingCollector model.OtelCollector
-	if err := h.db.Where("cluster_id = ? AND namespace = ? AND name = ?", req.ClusterID, req.Namespace, req.Name).First(&existingCollector).Error; err == nil {
-		respondWithError(w, http.StatusConflict, "CONFLICT", "Collector name already exists in this namespace")
+	if err := existing.First(&existingCollector).Error; err == nil {
+		respondWithError(w, http.StatusConflict, "CONFLICT", "Collector name already exists")
 		return
 	}
 
@@ -72,6 +206,8 @@ func (h *OtelHandler) CreateCollector(w http.ResponseWriter, r *http.Request) {
 		ID:              uuid.New(),
 		UserID:          userUUID,
 		ClusterID:       req.ClusterID,
+		HostID:          req.HostID,
+		Mode:            req.Mode,
 		Name:            req.Name,
 		Namespace:       req.Namespace,
 		Type:            req.Type,
@@ -82,20 +218,32 @@ func (h *OtelHandler) CreateCollector(w http.ResponseWriter, r *http.Request) {
 		MetricsEndpoint: req.MetricsEndpoint,
 		LogsEndpoint:    req.LogsEndpoint,
 		TracesEndpoint:  req.TracesEndpoint,
+		Image:           req.Image,
+		Version:         req.Version,
 	}
 
 	if collector.Replicas == 0 {
 		collector.Replicas = 1
 	}
 
+	if req.Pipeline != nil {
+		pipeline, err := json.Marshal(req.Pipeline)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid pipeline")
+			return
+		}
+		collector.Pipeline = string(pipeline)
+	}
+	if _, err := service.CollectorConfig(&collector); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_CONFIG", err.Error())
+		return
+	}
+
 	if err := h.db.Create(&collector).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create collector")
 		return
 	}
 
-	// TODO: Trigger Kubernetes deployment
-	// This would use the Kubernetes client to deploy the OTEL collector
-
 	respondWithJSON(w, http.StatusCreated, collector)
 }
 
@@ -296,16 +444,62 @@ func (h *OtelHandler) UpdateCollector(w http.ResponseWriter, r *http.Request) {
 	if req.TracesEndpoint != "" {
 		updates["traces_endpoint"] = req.TracesEndpoint
 	}
+	if req.Image != "" {
+		updates["image"] = req.Image
+	}
+	if req.Version != "" {
+		updates["version"] = req.Version
+	}
+	if req.Pipeline != nil {
+		pipeline, err := json.Marshal(req.Pipeline)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid pipeline")
+			return
+		}
+		updates["pipeline"] = string(pipeline)
+	}
+
+	// Validate the config the collector will run with before saving it
+	previousImage := service.CollectorImage(&collector)
+	updated := collector
+	if config, ok := updates["config"].(string); ok {
+		updated.Config = config
+	}
+	if pipeline, ok := updates["pipeline"].(string); ok {
+		updated.Pipeline = pipeline
+	}
+	if req.Image != "" {
+		updated.Image = req.Image
+	}
+	if req.Version != "" {
+		updated.Version = req.Version
+	}
+	config, err := service.CollectorConfig(&updated)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_CONFIG", err.Error())
+		return
+	}
 
 	if err := h.db.Model(&collector).Updates(updates).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update collector")
 		return
 	}
 
-	// TODO: Trigger Kubernetes update
-
 	// Fetch updated collector
 	h.db.Preload("Cluster").First(&collector, collectorUUID)
+
+	// Roll live collectors onto the new config or image. Deploy only restarts
+	// pods or the unit when the config hash or image actually changed.
+	live := collector.Status == model.CollectorStatusRunning || collector.Status == model.CollectorStatusDeploying
+	if live && (service.ConfigHash(config) != collector.ConfigHash || service.CollectorImage(&collector) != previousImage) {
+		ctx, cancel := context.WithTimeout(r.Context(), collectorOpTimeout)
+		defer cancel()
+		if err := h.collectors.Deploy(ctx, &collector, &userUUID); err != nil {
+			respondWithCollectorError(w, err)
+			return
+		}
+	}
+
 	respondWithJSON(w, http.StatusOK, collector)
 }
 
@@ -355,7 +549,16 @@ func (h *OtelHandler) DeleteCollector(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Trigger Kubernetes undeployment
+	// Remove deployed resources; collectors that never ran may have nothing left to reach
+	ctx, cancel := context.WithTimeout(r.Context(), collectorOpTimeout)
+	defer cancel()
+	if err := h.collectors.Remove(ctx, &collector, &userUUID); err != nil {
+		neverDeployed := collector.Status == model.CollectorStatusPending || collector.Status == model.CollectorStatusStopped
+		if !neverDeployed || !errors.Is(err, service.ErrCollectorTargetUnavailable) {
+			respondWithCollectorError(w, err)
+			return
+		}
+	}
 
 	// Delete collector
 	if err := h.db.Delete(&collector).Error; err != nil {
@@ -414,18 +617,13 @@ func (h *OtelHandler) GetCollectorStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// TODO: Get actual status from Kubernetes
-	status := model.CollectorDeploymentStatus{
-		Status:        collector.Status,
-		PodNames:      []string{},
-		Replicas:      collector.Replicas,
-		ReadyReplicas: 0,
-		ErrorMessage:  "",
-	}
+	ctx, cancel := context.WithTimeout(r.Context(), collectorOpTimeout)
+	defer cancel()
 
-	if collector.Status == model.CollectorStatusRunning {
-		status.ReadyReplicas = collector.Replicas
-		status.MetricsURL = "/metrics"
+	status, err := h.collectors.CheckHealth(ctx, &collector, &userUUID)
+	if err != nil {
+		respondWithCollectorError(w, err)
+		return
 	}
 
 	respondWithJSON(w, http.StatusOK, status)
@@ -477,11 +675,13 @@ func (h *OtelHandler) StartCollector(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Trigger Kubernetes deployment
+	ctx, cancel := context.WithTimeout(r.Context(), collectorOpTimeout)
+	defer cancel()
 
-	// Update status
-	collector.Status = model.CollectorStatusDeploying
-	h.db.Save(&collector)
+	if err := h.collectors.Deploy(ctx, &collector, &userUUID); err != nil {
+		respondWithCollectorError(w, err)
+		return
+	}
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Collector deployment initiated",
@@ -534,11 +734,13 @@ func (h *OtelHandler) StopCollector(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Trigger Kubernetes undeployment
+	ctx, cancel := context.WithTimeout(r.Context(), collectorOpTimeout)
+	defer cancel()
 
-	// Update status
-	collector.Status = model.CollectorStatusStopped
-	h.db.Save(&collector)
+	if err := h.collectors.Stop(ctx, &collector, &userUUID); err != nil {
+		respondWithCollectorError(w, err)
+		return
+	}
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Collector stopped successfully",
@@ -591,9 +793,29 @@ func (h *OtelHandler) RestartCollector(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Trigger Kubernetes restart
+	ctx, cancel := context.WithTimeout(r.Context(), collectorOpTimeout)
+	defer cancel()
+
+	if err := h.collectors.Restart(ctx, &collector, &userUUID); err != nil {
+		respondWithCollectorError(w, err)
+		return
+	}
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Collector restart initiated",
 	})
 }
+
+// respondWithCollectorError maps collector deployment errors to HTTP responses
+func respondWithCollectorError(w http.ResponseWriter, err error) {
+	var invalid *service.ConfigValidationError
+	if errors.As(err, &invalid) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_CONFIG", err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrCollectorTargetUnavailable) {
+		respondWithError(w, http.StatusServiceUnavailable, "TARGET_UNAVAILABLE", err.Error())
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, "DEPLOY_ERROR", err.Error())
+}
@@ -0,0 +1,340 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// fakeClusterRepository keeps clusters in memory
+type fakeClusterRepository struct {
+	clusters map[uuid.UUID]model.K8sCluster
+}
+
+func (f *fakeClusterRepository) Create(ctx context.Context, cluster *model.K8sCluster) error {
+	f.clusters[cluster.ID] = *cluster
+	return nil
+}
+
+func (f *fakeClusterRepository) FindByID(ctx context.Context, id uuid.UUID) (*model.K8sCluster, error) {
+	cluster, ok := f.clusters[id]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	return &cluster, nil
+}
+
+func (f *fakeClusterRepository) FindOwned(ctx context.Context, id, userID uuid.UUID) (*model.K8sCluster, error) {
+	cluster, ok := f.clusters[id]
+	if !ok || cluster.UserID != userID {
+		return nil, db.ErrNotFound
+	}
+	return &cluster, nil
+}
+
+func (f *fakeClusterRepository) List(ctx context.Context, filter *db.ClusterFilter) ([]model.K8sCluster, int64, error) {
+	var clusters []model.K8sCluster
+	for _, cluster := range f.clusters {
+		if cluster.UserID == filter.UserID {
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters, int64(len(clusters)), nil
+}
+
+func (f *fakeClusterRepository) Update(ctx context.Context, cluster *model.K8sCluster, fields ...string) error {
+	f.clusters[cluster.ID] = *cluster
+	return nil
+}
+
+func (f *fakeClusterRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(f.clusters, id)
+	return nil
+}
+
+func (f *fakeClusterRepository) ListNodes(ctx context.Context, clusterID uuid.UUID) ([]model.ClusterNode, error) {
+	return []model.ClusterNode{}, nil
+}
+
+func (f *fakeClusterRepository) ReplaceNodes(ctx context.Context, clusterID uuid.UUID, nodes []model.ClusterNode) error {
+	return nil
+}
+
+func (f *fakeClusterRepository) FindVeleroInstallation(ctx context.Context, clusterID uuid.UUID) (*model.VeleroInstallation, error) {
+	return nil, db.ErrNotFound
+}
+
+// fakeDataSourceRepository keeps data sources in memory
+type fakeDataSourceRepository struct {
+	dataSources map[uuid.UUID]model.PrometheusDataSource
+}
+
+func (f *fakeDataSourceRepository) Create(ctx context.Context, dataSource *model.PrometheusDataSource) error {
+	dataSource.ID = uuid.New()
+	f.dataSources[dataSource.ID] = *dataSource
+	return nil
+}
+
+func (f *fakeDataSourceRepository) FindOwned(ctx context.Context, id, userID uuid.UUID) (*model.PrometheusDataSource, error) {
+	dataSource, ok := f.dataSources[id]
+	if !ok || dataSource.UserID != userID {
+		return nil, db.ErrNotFound
+	}
+	return &dataSource, nil
+}
+
+func (f *fakeDataSourceRepository) NameTaken(ctx context.Context, userID uuid.UUID, name string, except uuid.UUID) (bool, error) {
+	for id, dataSource := range f.dataSources {
+		if id != except && dataSource.UserID == userID && dataSource.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeDataSourceRepository) List(ctx context.Context, filter *db.DataSourceFilter) ([]model.PrometheusDataSource, int64, error) {
+	var dataSources []model.PrometheusDataSource
+	for _, dataSource := range f.dataSources {
+		if dataSource.UserID == filter.UserID {
+			dataSources = append(dataSources, dataSource)
+		}
+	}
+	return dataSources, int64(len(dataSources)), nil
+}
+
+func (f *fakeDataSourceRepository) Update(ctx context.Context, dataSource *model.PrometheusDataSource, fields ...string) error {
+	f.dataSources[dataSource.ID] = *dataSource
+	return nil
+}
+
+func (f *fakeDataSourceRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(f.dataSources, id)
+	return nil
+}
+
+// fakeAlertRuleRepository keeps alert rules in memory
+type fakeAlertRuleRepository struct {
+	rules map[uuid.UUID]model.AlertRule
+}
+
+func (f *fakeAlertRuleRepository) Create(ctx context.Context, rule *model.AlertRule) error {
+	f.rules[rule.ID] = *rule
+	return nil
+}
+
+func (f *fakeAlertRuleRepository) FindOwned(ctx context.Context, id, userID uuid.UUID) (*model.AlertRule, error) {
+	rule, ok := f.rules[id]
+	if !ok || rule.UserID != userID {
+		return nil, db.ErrNotFound
+	}
+	return &rule, nil
+}
+
+func (f *fakeAlertRuleRepository) List(ctx context.Context, filter *db.AlertRuleFilter) ([]model.AlertRule, int64, error) {
+	return nil, 0, nil
+}
+
+func (f *fakeAlertRuleRepository) Update(ctx context.Context, rule *model.AlertRule, fields ...string) error {
+	f.rules[rule.ID] = *rule
+	return nil
+}
+
+func (f *fakeAlertRuleRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(f.rules, id)
+	return nil
+}
+
+// serveAs runs handler for a request made by userID and returns the response
+func serveAs(handler http.HandlerFunc, userID uuid.UUID, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req = req.WithContext(context.WithValue(req.Context(), "user_id", userID.String()))
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+// errorCode returns the code of an error response
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+	}
+	return resp.Error.Code
+}
+
+func TestClusterOwnership(t *testing.T) {
+	owner, stranger := uuid.New(), uuid.New()
+	cluster := model.K8sCluster{ID: uuid.New(), UserID: owner, Name: "prod"}
+	clusters := &fakeClusterRepository{clusters: map[uuid.UUID]model.K8sCluster{cluster.ID: cluster}}
+	h := NewClusterHandler(service.NewClusterService(clusters, nil, nil))
+	path := "/api/v1/clusters/" + cluster.ID.String()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		path    string
+		userID  uuid.UUID
+		body    interface{}
+		status  int
+	}{
+		{"owner gets", h.GetCluster, http.MethodGet, path, owner, nil, http.StatusOK},
+		{"stranger gets", h.GetCluster, http.MethodGet, path, stranger, nil, http.StatusNotFound},
+		{"missing cluster", h.GetCluster, http.MethodGet, "/api/v1/clusters/" + uuid.NewString(), owner, nil, http.StatusNotFound},
+		{"stranger updates", h.UpdateCluster, http.MethodPut, path, stranger, model.UpdateClusterRequest{Name: "mine"}, http.StatusNotFound},
+		{"stranger lists nodes", h.GetClusterNodes, http.MethodGet, path + "/nodes", stranger, nil, http.StatusNotFound},
+		{"stranger deletes", h.DeleteCluster, http.MethodDelete, path, stranger, nil, http.StatusNotFound},
+		{"owner lists nodes", h.GetClusterNodes, http.MethodGet, path + "/nodes", owner, nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAs(tt.handler, tt.userID, tt.method, tt.path, tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusNotFound && errorCode(t, w) != "NOT_FOUND" {
+				t.Errorf("code = %q, want NOT_FOUND", errorCode(t, w))
+			}
+		})
+	}
+
+	if stored := clusters.clusters[cluster.ID]; stored.Name != "prod" {
+		t.Errorf("a stranger renamed the cluster to %q", stored.Name)
+	}
+	if w := serveAs(h.DeleteCluster, owner, http.MethodDelete, path, nil); w.Code != http.StatusOK {
+		t.Fatalf("owner delete status = %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := clusters.clusters[cluster.ID]; ok {
+		t.Error("cluster still stored after its owner deleted it")
+	}
+}
+
+func TestDataSourceOwnership(t *testing.T) {
+	owner, stranger := uuid.New(), uuid.New()
+	cluster := model.K8sCluster{ID: uuid.New(), UserID: owner}
+	clusters := &fakeClusterRepository{clusters: map[uuid.UUID]model.K8sCluster{cluster.ID: cluster}}
+	dataSources := &fakeDataSourceRepository{dataSources: map[uuid.UUID]model.PrometheusDataSource{}}
+	dataSourceService := service.NewDataSourceService(dataSources, clusters)
+	h := &PrometheusHandler{dataSources: dataSourceService}
+	ctx := context.Background()
+
+	prod, err := dataSourceService.Create(ctx, owner, &model.CreatePrometheusDataSourceRequest{Name: "prod", URL: "http://prod:9090", ClusterID: &cluster.ID})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := dataSourceService.Create(ctx, owner, &model.CreatePrometheusDataSourceRequest{Name: "staging", URL: "http://staging:9090"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	path := "/api/v1/prometheus/datasources/" + prod.ID.String()
+	staging := "staging"
+	renamed := "renamed"
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		userID  uuid.UUID
+		body    interface{}
+		status  int
+		code    string
+	}{
+		{"owner gets", h.GetDataSource, http.MethodGet, owner, nil, http.StatusOK, ""},
+		{"stranger gets", h.GetDataSource, http.MethodGet, stranger, nil, http.StatusNotFound, "NOT_FOUND"},
+		{"stranger updates", h.UpdateDataSource, http.MethodPut, stranger, model.UpdatePrometheusDataSourceRequest{Name: &renamed}, http.StatusNotFound, "NOT_FOUND"},
+		{"stranger deletes", h.DeleteDataSource, http.MethodDelete, stranger, nil, http.StatusNotFound, "NOT_FOUND"},
+		{"owner takes a used name", h.UpdateDataSource, http.MethodPut, owner, model.UpdatePrometheusDataSourceRequest{Name: &staging}, http.StatusConflict, "CONFLICT"},
+		{"owner renames", h.UpdateDataSource, http.MethodPut, owner, model.UpdatePrometheusDataSourceRequest{Name: &renamed}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAs(tt.handler, tt.userID, tt.method, path, tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.code != "" && errorCode(t, w) != tt.code {
+				t.Errorf("code = %q, want %q", errorCode(t, w), tt.code)
+			}
+		})
+	}
+
+	// Data sources can only be attached to the user's own clusters
+	_, err = dataSourceService.Create(ctx, stranger, &model.CreatePrometheusDataSourceRequest{Name: "theirs", URL: "http://theirs:9090", ClusterID: &cluster.ID})
+	if !errors.Is(err, service.ErrClusterNotFound) {
+		t.Fatalf("Create() on another user's cluster error = %v, want ErrClusterNotFound", err)
+	}
+	w := httptest.NewRecorder()
+	respondWithDataSourceError(w, err, "Failed to create data source")
+	if w.Code != http.StatusNotFound || errorCode(t, w) != "NOT_FOUND" {
+		t.Errorf("status = %d, code = %q, want 404 NOT_FOUND", w.Code, errorCode(t, w))
+	}
+}
+
+func TestAlertRuleOwnership(t *testing.T) {
+	owner, stranger := uuid.New(), uuid.New()
+	rule := model.AlertRule{ID: uuid.New(), UserID: owner, Name: "cpu"}
+	rules := &fakeAlertRuleRepository{rules: map[uuid.UUID]model.AlertRule{rule.ID: rule}}
+	h := NewAlertHandler(nil, service.NewAlertRuleService(rules))
+	path := "/api/v1/alert-rules/" + rule.ID.String()
+
+	if w := serveAs(h.GetAlertRule, owner, http.MethodGet, path, nil); w.Code != http.StatusOK {
+		t.Fatalf("owner get status = %d: %s", w.Code, w.Body.String())
+	}
+	for _, handler := range []http.HandlerFunc{h.GetAlertRule, h.DeleteAlertRule} {
+		w := serveAs(handler, stranger, http.MethodGet, path, nil)
+		if w.Code != http.StatusNotFound || errorCode(t, w) != "NOT_FOUND" {
+			t.Errorf("stranger status = %d, code = %q, want 404 NOT_FOUND", w.Code, errorCode(t, w))
+		}
+	}
+	if _, ok := rules.rules[rule.ID]; !ok {
+		t.Error("a stranger deleted the alert rule")
+	}
+}
+
+func TestRepositoryErrorMapping(t *testing.T) {
+	// Wrapped errors map like the errors they wrap. Anything else is a 500, so
+	// services must translate db.ErrNotFound into their own not found errors.
+	tests := []struct {
+		name    string
+		respond func(http.ResponseWriter, error, string)
+		err     error
+		status  int
+	}{
+		{"cluster not found", respondWithClusterError, fmt.Errorf("lookup: %w", service.ErrClusterNotFound), http.StatusNotFound},
+		{"cluster storage failure", respondWithClusterError, errors.New("connection refused"), http.StatusInternalServerError},
+		{"data source not found", respondWithDataSourceError, service.ErrPrometheusDataSourceNotFound, http.StatusNotFound},
+		{"data source cluster not found", respondWithDataSourceError, service.ErrClusterNotFound, http.StatusNotFound},
+		{"data source invalid", respondWithDataSourceError, fmt.Errorf("%w: bad flavor", service.ErrInvalidPrometheusDataSource), http.StatusBadRequest},
+		{"data source exists", respondWithDataSourceError, service.ErrPrometheusDataSourceExists, http.StatusConflict},
+		{"untranslated repository error", respondWithDataSourceError, db.ErrNotFound, http.StatusInternalServerError},
+		{"alert rule not found", respondWithAlertRuleError, service.ErrAlertRuleNotFound, http.StatusNotFound},
+		{"alert rule storage failure", respondWithAlertRuleError, errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.respond(w, tt.err, "fallback")
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
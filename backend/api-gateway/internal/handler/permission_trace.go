@@ -0,0 +1,86 @@
+// Package handler provides the permission evaluation trace endpoint
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// PermissionTraceHandler explains permission decisions to administrators
+type PermissionTraceHandler struct {
+	db *gorm.DB
+}
+
+// NewPermissionTraceHandler creates a new permission trace handler
+func NewPermissionTraceHandler(db *gorm.DB) *PermissionTraceHandler {
+	return &PermissionTraceHandler{db: db}
+}
+
+// ExplainPermission evaluates a permission for the user in /api/v1/rbac/users/{id}/explain-permission
+// and returns the full trace: the policies and roles that matched or did not, which
+// one decided, and a single change that would flip the decision
+func (h *PermissionTraceHandler) ExplainPermission(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, callerID, "roles", "list", nil, "") {
+		return
+	}
+
+	parts := splitPath(r.URL.Path)
+	if len(parts) < 6 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+	userID, err := uuid.Parse(parts[4])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID")
+		return
+	}
+
+	var req model.CheckPermissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if req.Resource == "" || req.Action == "" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "resource and action are required")
+		return
+	}
+
+	var user model.User
+	if err := h.db.Select("id", "username").First(&user, "id = ?", userID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to load user")
+		return
+	}
+
+	// Explain against the stored state rather than a cached set
+	set, err := model.LoadPermissionSet(h.db, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to load permissions")
+		return
+	}
+	target := req.Target()
+	if target.Labels == nil && set.SelectsByTag(req.Resource, req.Action) {
+		if target.Tags, err = model.PermissionTargetTags(h.db, target); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to load the tags of the target")
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"userId":   user.ID,
+		"username": user.Username,
+		"target":   req,
+		"trace":    set.Explain(req.Resource, req.Action, target),
+	})
+}
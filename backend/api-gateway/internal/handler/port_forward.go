@@ -0,0 +1,254 @@
+// Package handler provides port-forwarding to cluster pods over websockets
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+const (
+	portForwardBufferSize = 32 * 1024
+)
+
+// PortForwardHandler forwards a TCP connection to a pod or service port over a
+// websocket: binary messages carry the connection's bytes in both directions
+type PortForwardHandler struct {
+	db       *gorm.DB
+	forwards *service.PortForwardService
+}
+
+// NewPortForwardHandler creates a new port-forward handler
+func NewPortForwardHandler(db *gorm.DB, forwards *service.PortForwardService) *PortForwardHandler {
+	return &PortForwardHandler{db: db, forwards: forwards}
+}
+
+// portForwardEnd is why one side of a forwarded connection stopped
+type portForwardEnd struct {
+	reason string
+	err    error
+}
+
+// ServeHTTP upgrades to a websocket forwarded to ?port of ?podName, or of a ready
+// pod behind ?serviceName, in ?namespace of ?clusterId. ?ttl shortens the session.
+// Checks run before the upgrade so they fail with a normal error response.
+func (h *PortForwardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, userID, ok := authenticateWebSocket(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	clusterID, err := uuid.Parse(query.Get("clusterId"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_CLUSTER_ID", "Invalid cluster ID")
+		return
+	}
+	req := &model.PortForwardRequest{
+		ClusterID:   clusterID,
+		Namespace:   query.Get("namespace"),
+		PodName:     query.Get("podName"),
+		ServiceName: query.Get("serviceName"),
+	}
+	if value := query.Get("port"); value != "" {
+		port, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid port")
+			return
+		}
+		req.Port = int32(port)
+	}
+	if value := query.Get("ttl"); value != "" {
+		if req.TTL, err = time.ParseDuration(value); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_DURATION", "Invalid duration format")
+			return
+		}
+	}
+
+	cluster, err := namespaceCluster(h.db, userID, clusterID, req.Namespace, "pods", "portforward")
+	if errors.Is(err, errNamespaceDenied) {
+		respondWithError(w, http.StatusForbidden, "PERMISSION_DENIED", "Permission pods.portforward required in namespace "+req.Namespace)
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+		return
+	}
+	if !enforceQuota(w, userID, model.QuotaResourcePortForwards, 1) {
+		return
+	}
+
+	username, _ := r.Context().Value("username").(string)
+	pf, err := h.forwards.Open(r.Context(), cluster, req, service.PortForwardUser{
+		ID:        userID,
+		Username:  username,
+		IPAddress: r.RemoteAddr,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPortForward):
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		case errors.Is(err, service.ErrPortForwardUnreachable):
+			respondWithError(w, http.StatusBadGateway, "PORT_FORWARD_FAILED", err.Error())
+		default:
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to open port-forward session")
+		}
+		return
+	}
+
+	conn, err := upgradeWebSocket(w, r, userID)
+	if err != nil {
+		h.forwards.Close(pf, model.PortForwardFailed, err)
+		return
+	}
+	defer conn.Close()
+
+	h.forward(conn, pf)
+}
+
+// forward copies bytes between the websocket and the pod until either side closes
+// or the session ends, then closes the session
+func (h *PortForwardHandler) forward(conn *wsConn, pf *service.PortForward) {
+	connected, _ := json.Marshal(map[string]interface{}{
+		"type":      "connected",
+		"sessionId": pf.Session.ID,
+		"podName":   pf.Session.PodName,
+		"port":      pf.Session.Port,
+		"expiresAt": pf.Session.ExpiresAt,
+	})
+	if err := conn.WriteMessage(websocket.TextMessage, connected); err != nil {
+		h.forwards.Close(pf, model.PortForwardClosedByClient, nil)
+		return
+	}
+
+	// Both copies report once, so neither blocks after the other ended the session
+	ended := make(chan portForwardEnd, 2)
+
+	// Pod to client
+	go func() {
+		buf := make([]byte, portForwardBufferSize)
+		for {
+			n, err := pf.Conn.Read(buf)
+			if n > 0 {
+				if err := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+					ended <- portForwardEnd{reason: model.PortForwardClosedByClient}
+					return
+				}
+				pf.CountOut(n)
+			}
+			if errors.Is(err, io.EOF) {
+				ended <- portForwardEnd{reason: model.PortForwardClosedByPod}
+				return
+			} else if err != nil {
+				ended <- portForwardEnd{reason: model.PortForwardFailed, err: err}
+				return
+			}
+		}
+	}()
+
+	// Client to pod; text messages are not part of the connection
+	go func() {
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				ended <- portForwardEnd{reason: model.PortForwardClosedByClient}
+				return
+			}
+			if messageType != websocket.BinaryMessage {
+				continue
+			}
+			if _, err := pf.Conn.Write(data); err != nil {
+				ended <- portForwardEnd{reason: model.PortForwardFailed, err: err}
+				return
+			}
+			pf.CountIn(len(data))
+		}
+	}()
+
+	var end portForwardEnd
+	select {
+	case end = <-ended:
+	case <-pf.Done():
+		// Expired or terminated; Close records which
+	}
+
+	h.forwards.Close(pf, end.reason, end.err)
+	conn.CloseWith(websocket.CloseNormalClosure, pf.Session.CloseReason)
+}
+
+// ListSessions lists the user's most recent port-forward sessions. ?status=active
+// lists open sessions only; ?all=true lists everyone's and requires audit.view.
+func (h *PortForwardHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	owner := &userID
+	if query.Get("all") == "true" {
+		if !requirePermission(w, h.db, userID, "audit", "view", nil, "") {
+			return
+		}
+		owner = nil
+	}
+	limit := 50
+	if value, err := strconv.Atoi(query.Get("limit")); err == nil && value > 0 && value <= 500 {
+		limit = value
+	}
+
+	sessions, err := h.forwards.List(owner, model.PortForwardStatus(query.Get("status")), limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list port-forward sessions")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  sessions,
+		"total": len(sessions),
+	})
+}
+
+// TerminateSession closes an open port-forward session. Users may close their own
+// sessions; closing another user's requires clusters.update on its cluster.
+func (h *PortForwardHandler) TerminateSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	sessionID, ok := pathUUID(w, r, 4, "session")
+	if !ok {
+		return
+	}
+
+	session, err := h.forwards.Get(sessionID)
+	if errors.Is(err, service.ErrPortForwardNotFound) {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Port-forward session not found")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get port-forward session")
+		return
+	}
+	if session.UserID != userID && !requirePermission(w, h.db, userID, "clusters", "update", &session.ClusterID, "cluster") {
+		return
+	}
+	if session.Status != model.PortForwardActive {
+		respondWithError(w, http.StatusConflict, "SESSION_CLOSED", "Port-forward session is already closed")
+		return
+	}
+
+	if err := h.forwards.Terminate(sessionID); err != nil {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Port-forward session is not open on this gateway")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Port-forward session terminated",
+	})
+}
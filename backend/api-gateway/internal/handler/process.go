@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
 	"github.com/wangjialin/myops/pkg/model"
 	"github.com/wangjialin/myops/pkg/ssh"
 	"gorm.io/gorm"
@@ -15,12 +16,22 @@ import (
 
 // ProcessManagementHandler handles process management operations
 type ProcessManagementHandler struct {
-	db *gorm.DB
+	db       *gorm.DB
+	commands *service.AgentCommandService
+	flags    *service.FeatureFlagService
 }
 
 // NewProcessManagementHandler creates a new process management handler
 func NewProcessManagementHandler(db *gorm.DB) *ProcessManagementHandler {
-	return &ProcessManagementHandler{db: db}
+	return &ProcessManagementHandler{
+		db:       db,
+		commands: service.NewAgentCommandService(db),
+	}
+}
+
+// SetFeatureFlags sets the flags that gate agent command operations
+func (h *ProcessManagementHandler) SetFeatureFlags(flags *service.FeatureFlagService) {
+	h.flags = flags
 }
 
 // ListProcesses handles process list requests
@@ -61,6 +72,29 @@ func (h *ProcessManagementHandler) ListProcesses(w http.ResponseWriter, r *http.
 		return
 	}
 
+	// Prefer a live process list from the agent; fall back to SSH
+	if service.AgentAvailable(&host) {
+		output, err := h.runOnAgent(r, &host, userID, model.AgentCommandProcessList, nil)
+		if err != nil {
+			respondWithError(w, http.StatusBadGateway, "AGENT_COMMAND_FAILED", fmt.Sprintf("Failed to list processes: %v", err))
+			return
+		}
+
+		var processes []model.ProcessInfo
+		if err := json.Unmarshal([]byte(output), &processes); err != nil {
+			respondWithError(w, http.StatusBadGateway, "INVALID_AGENT_RESPONSE", "Agent returned an invalid process list")
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"data": model.ListProcessesResponse{
+				Processes: processes,
+				Count:     len(processes),
+			},
+		})
+		return
+	}
+
 	// Create SSH client
 	config := &ssh.SSHConfig{
 		HostID:     req.HostID.String(),
@@ -234,6 +268,154 @@ func (h *ProcessManagementHandler) KillProcess(w http.ResponseWriter, r *http.Re
 	})
 }
 
+// ReniceProcess handles requests to change a process's CPU priority
+func (h *ProcessManagementHandler) ReniceProcess(w http.ResponseWriter, r *http.Request) {
+	var req model.ReniceProcessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	if req.PID <= 0 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PID", "Invalid process ID")
+		return
+	}
+	if req.Priority < -20 || req.Priority > 19 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PRIORITY", "Priority must be between -20 and 19")
+		return
+	}
+
+	// Get user ID from context
+	var userID uuid.UUID
+	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
+		if uid, ok := userIDVal.(string); ok {
+			userID, _ = uuid.Parse(uid)
+		}
+	}
+
+	if userID == (uuid.UUID{}) {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return
+	}
+
+	if !requirePermission(w, h.db, userID, "hosts", "services", &req.HostID, "host") {
+		return
+	}
+
+	host, ok := h.availableHost(w, req.HostID)
+	if !ok {
+		return
+	}
+
+	if service.AgentAvailable(host) {
+		args := map[string]int32{"pid": req.PID, "priority": req.Priority}
+		if _, err := h.runOnAgent(r, host, userID, model.AgentCommandProcessRenice, args); err != nil {
+			respondWithError(w, http.StatusBadGateway, "RENICE_FAILED", fmt.Sprintf("Failed to renice process: %v", err))
+			return
+		}
+	} else {
+		client, err := ssh.NewProcessClient(&ssh.SSHConfig{
+			HostID:     req.HostID.String(),
+			IPAddress:  host.IPAddress,
+			Port:       host.Port,
+			Username:   req.Username,
+			Password:   req.Password,
+			PrivateKey: []byte(req.Key),
+			Timeout:    30 * time.Second,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "CONNECTION_FAILED", fmt.Sprintf("Failed to connect: %v", err))
+			return
+		}
+		defer client.Close()
+
+		if err := client.ReniceProcess(req.PID, req.Priority); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "RENICE_FAILED", fmt.Sprintf("Failed to renice process: %v", err))
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": fmt.Sprintf("Process %d priority set to %d", req.PID, req.Priority),
+	})
+}
+
+// IoniceProcess handles requests to change a process's I/O scheduling
+func (h *ProcessManagementHandler) IoniceProcess(w http.ResponseWriter, r *http.Request) {
+	var req model.IoniceProcessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	if req.PID <= 0 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PID", "Invalid process ID")
+		return
+	}
+	if req.Class < 1 || req.Class > 3 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_CLASS", "Class must be 1 (realtime), 2 (best-effort) or 3 (idle)")
+		return
+	}
+	if req.Level < 0 || req.Level > 7 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_LEVEL", "Level must be between 0 and 7")
+		return
+	}
+
+	// Get user ID from context
+	var userID uuid.UUID
+	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
+		if uid, ok := userIDVal.(string); ok {
+			userID, _ = uuid.Parse(uid)
+		}
+	}
+
+	if userID == (uuid.UUID{}) {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return
+	}
+
+	if !requirePermission(w, h.db, userID, "hosts", "services", &req.HostID, "host") {
+		return
+	}
+
+	host, ok := h.availableHost(w, req.HostID)
+	if !ok {
+		return
+	}
+
+	if service.AgentAvailable(host) {
+		args := map[string]int32{"pid": req.PID, "class": req.Class, "level": req.Level}
+		if _, err := h.runOnAgent(r, host, userID, model.AgentCommandProcessIonice, args); err != nil {
+			respondWithError(w, http.StatusBadGateway, "IONICE_FAILED", fmt.Sprintf("Failed to ionice process: %v", err))
+			return
+		}
+	} else {
+		client, err := ssh.NewProcessClient(&ssh.SSHConfig{
+			HostID:     req.HostID.String(),
+			IPAddress:  host.IPAddress,
+			Port:       host.Port,
+			Username:   req.Username,
+			Password:   req.Password,
+			PrivateKey: []byte(req.Key),
+			Timeout:    30 * time.Second,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "CONNECTION_FAILED", fmt.Sprintf("Failed to connect: %v", err))
+			return
+		}
+		defer client.Close()
+
+		if err := client.IoniceProcess(req.PID, req.Class, req.Level); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "IONICE_FAILED", fmt.Sprintf("Failed to ionice process: %v", err))
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": fmt.Sprintf("Process %d I/O class set to %d (level %d)", req.PID, req.Class, req.Level),
+	})
+}
+
 // ExecuteCommand handles command execution requests
 func (h *ProcessManagementHandler) ExecuteCommand(w http.ResponseWriter, r *http.Request) {
 	var req model.ExecuteCommandRequest
@@ -417,6 +599,83 @@ func (h *ProcessManagementHandler) GetExecutions(w http.ResponseWriter, r *http.
 
 // Helper functions
 
+// availableHost loads a host and checks that it can accept operations, writing the error response if not
+func (h *ProcessManagementHandler) availableHost(w http.ResponseWriter, hostID uuid.UUID) (*model.Host, bool) {
+	var host model.Host
+	err := h.db.Where("id = ?", hostID).First(&host).Error
+	if err == gorm.ErrRecordNotFound {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Host not found")
+		return nil, false
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
+		return nil, false
+	}
+
+	if host.Status != model.HostStatusApproved && host.Status != model.HostStatusOnline {
+		respondWithError(w, http.StatusForbidden, "HOST_NOT_AVAILABLE", "Host is not available")
+		return nil, false
+	}
+	return &host, true
+}
+
+// agentHost authenticates the user, checks the hosts permission for action (if any) and
+// resolves a host whose agent can take commands. Agent-only operations have no SSH fallback.
+func (h *ProcessManagementHandler) agentHost(w http.ResponseWriter, r *http.Request, hostIDStr, action string) (*model.Host, uuid.UUID, bool) {
+	hostID, err := uuid.Parse(hostIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_HOST_ID", "Invalid host ID")
+		return nil, uuid.UUID{}, false
+	}
+
+	// Get user ID from context
+	var userID uuid.UUID
+	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
+		if uid, ok := userIDVal.(string); ok {
+			userID, _ = uuid.Parse(uid)
+		}
+	}
+
+	if userID == (uuid.UUID{}) {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return nil, uuid.UUID{}, false
+	}
+
+	if !requireFeature(w, h.flags, userID, model.FeatureAgentCommands) {
+		return nil, uuid.UUID{}, false
+	}
+
+	if action != "" && !requirePermission(w, h.db, userID, "hosts", action, &hostID, "host") {
+		return nil, uuid.UUID{}, false
+	}
+
+	host, ok := h.availableHost(w, hostID)
+	if !ok {
+		return nil, uuid.UUID{}, false
+	}
+
+	if !service.AgentAvailable(host) {
+		respondWithError(w, http.StatusServiceUnavailable, "AGENT_UNAVAILABLE", "Host agent is not connected")
+		return nil, uuid.UUID{}, false
+	}
+
+	return host, userID, true
+}
+
+// runOnAgent dispatches a command to the host's agent and returns its output
+func (h *ProcessManagementHandler) runOnAgent(r *http.Request, host *model.Host, userID uuid.UUID, cmdType model.AgentCommandType, args interface{}) (string, error) {
+	cmd, err := h.commands.Dispatch(r.Context(), host.ID, &userID, cmdType, args, 30*time.Second)
+	if err != nil {
+		return "", err
+	}
+	if cmd.Status != model.AgentCommandStatusCompleted {
+		if cmd.ErrorMessage != "" {
+			return cmd.Output, fmt.Errorf("%s", cmd.ErrorMessage)
+		}
+		return cmd.Output, fmt.Errorf("command %s", cmd.Status)
+	}
+	return cmd.Output, nil
+}
+
 func (h *ProcessManagementHandler) updateExecutionStatus(executionID uuid.UUID, status string, exitCode *int32, stdout, stderr string, duration int64) {
 	now := time.Now()
 	updates := map[string]interface{}{
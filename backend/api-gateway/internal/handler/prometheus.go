@@ -2,26 +2,39 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/db"
 	"github.com/wangjialin/myops/pkg/model"
 	"gorm.io/gorm"
 )
 
 // PrometheusHandler handles Prometheus integration operations
 type PrometheusHandler struct {
-	db *gorm.DB
+	db          *gorm.DB
+	renderer    *service.DashboardRenderService
+	queries     *service.PrometheusQueryService
+	dataSources *service.DataSourceService
+	rules       *service.PrometheusAlertRuleService
 }
 
 // NewPrometheusHandler creates a new Prometheus handler
-func NewPrometheusHandler(db *gorm.DB) *PrometheusHandler {
-	return &PrometheusHandler{db: db}
+func NewPrometheusHandler(db *gorm.DB, queries *service.PrometheusQueryService, dataSources *service.DataSourceService, rules *service.PrometheusAlertRuleService) *PrometheusHandler {
+	return &PrometheusHandler{
+		db:          db,
+		renderer:    service.NewDashboardRenderService(db),
+		queries:     queries,
+		dataSources: dataSources,
+		rules:       rules,
+	}
 }
 
 // ============== Data Source Management ==============
@@ -34,63 +47,17 @@ func (h *PrometheusHandler) CreateDataSource(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
-
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
+	if !enforceQuota(w, userID, model.QuotaResourceDataSources, 1) {
 		return
 	}
 
-	// Verify cluster ownership if provided
-	if req.ClusterID != nil {
-		var cluster model.K8sCluster
-		if err := h.db.Where("id = ? AND user_id = ?", req.ClusterID, userUUID).First(&cluster).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
-			} else {
-				respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch cluster")
-			}
-			return
-		}
-	}
-
-	// Check if data source name already exists
-	var existingDS model.PrometheusDataSource
-	if err := h.db.Where("user_id = ? AND name = ?", userUUID, req.Name).First(&existingDS).Error; err == nil {
-		respondWithError(w, http.StatusConflict, "CONFLICT", "Data source name already exists")
-		return
-	}
-
-	// Create data source
-	dataSource := model.PrometheusDataSource{
-		UserID:          userUUID,
-		ClusterID:       req.ClusterID,
-		Name:            req.Name,
-		URL:             req.URL,
-		Username:        req.Username,
-		Password:        req.Password,
-		Status:          model.DSStatusActive,
-		InsecureSkipTLS: req.InsecureSkipTLS,
-		CACert:          req.CACert,
-		ClientCert:      req.ClientCert,
-		ClientKey:       req.ClientKey,
-		Headers:         req.Headers,
-	}
-
-	if err := h.db.Create(&dataSource).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create data source")
+	dataSource, err := h.dataSources.Create(r.Context(), userID, &req)
+	if err != nil {
+		respondWithDataSourceError(w, err, "Failed to create data source")
 		return
 	}
 
@@ -99,71 +66,31 @@ func (h *PrometheusHandler) CreateDataSource(w http.ResponseWriter, r *http.Requ
 
 // ListDataSources lists all Prometheus data sources
 func (h *PrometheusHandler) ListDataSources(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
+	tags, ok := tagSelectorParam(w, r)
+	if !ok {
 		return
 	}
 
-	// Parse query parameters
-	page := 1
-	pageSize := 20
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
-		}
-	}
-	if pageSizeStr := r.URL.Query().Get("pageSize"); pageSizeStr != "" {
-		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= 100 {
-			pageSize = ps
-		}
-	}
-
-	// Build query
-	query := h.db.Model(&model.PrometheusDataSource{}).Where("user_id = ?", userUUID)
-
-	// Apply filters
-	if clusterID := r.URL.Query().Get("clusterId"); clusterID != "" {
-		clusterUUID, err := uuid.Parse(clusterID)
-		if err == nil {
-			query = query.Where("cluster_id = ?", clusterUUID)
-		}
+	page, pageSize := pageParams(r)
+	filter := &db.DataSourceFilter{
+		UserID:    userID,
+		ClusterID: queryUUID(r, "clusterId"),
+		Status:    r.URL.Query().Get("status"),
+		Tags:      tags,
+		Page:      page,
+		PageSize:  pageSize,
 	}
-	if status := r.URL.Query().Get("status"); status != "" {
-		query = query.Where("status = ?", status)
-	}
-
-	// Count total
-	var total int64
-	query.Count(&total)
-
-	// Fetch data sources
-	var dataSources []model.PrometheusDataSource
-	offset := (page - 1) * pageSize
-	if err := query.Preload("Cluster").Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&dataSources).Error; err != nil {
+	dataSources, total, err := h.dataSources.List(r.Context(), filter)
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch data sources")
 		return
 	}
 
-	// Remove sensitive data
-	for i := range dataSources {
-		dataSources[i].Password = ""
-		dataSources[i].ClientKey = ""
-	}
-
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"data":       dataSources,
 		"total":      total,
@@ -175,70 +102,28 @@ func (h *PrometheusHandler) ListDataSources(w http.ResponseWriter, r *http.Reque
 
 // GetDataSource gets a specific Prometheus data source
 func (h *PrometheusHandler) GetDataSource(w http.ResponseWriter, r *http.Request) {
-	// Extract data source ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 5 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID")
-		return
-	}
-
-	dataSourceID := parts[4]
-	dataSourceUUID, err := uuid.Parse(dataSourceID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID format")
-		return
-	}
-
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+	dataSourceID, ok := pathUUID(w, r, 4, "data source")
+	if !ok {
 		return
 	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	dataSource, err := h.dataSources.Get(r.Context(), dataSourceID, userID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
+		respondWithDataSourceError(w, err, "Failed to fetch data source")
 		return
 	}
 
-	// Fetch data source
-	var dataSource model.PrometheusDataSource
-	if err := h.db.Preload("Cluster").Where("id = ? AND user_id = ?", dataSourceUUID, userUUID).First(&dataSource).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Data source not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch data source")
-		}
-		return
-	}
-
-	// Remove sensitive data
-	dataSource.Password = ""
-	dataSource.ClientKey = ""
-
 	respondWithJSON(w, http.StatusOK, dataSource)
 }
 
 // UpdateDataSource updates a Prometheus data source
 func (h *PrometheusHandler) UpdateDataSource(w http.ResponseWriter, r *http.Request) {
-	// Extract data source ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 5 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID")
-		return
-	}
-
-	dataSourceID := parts[4]
-	dataSourceUUID, err := uuid.Parse(dataSourceID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID format")
+	dataSourceID, ok := pathUUID(w, r, 4, "data source")
+	if !ok {
 		return
 	}
 
@@ -248,131 +133,33 @@ func (h *PrometheusHandler) UpdateDataSource(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	dataSource, err := h.dataSources.Update(r.Context(), dataSourceID, userID, &req)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
-		return
-	}
-
-	// Fetch data source
-	var dataSource model.PrometheusDataSource
-	if err := h.db.Where("id = ? AND user_id = ?", dataSourceUUID, userUUID).First(&dataSource).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Data source not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch data source")
-		}
+		respondWithDataSourceError(w, err, "Failed to update data source")
 		return
 	}
 
-	// Update fields
-	updates := map[string]interface{}{}
-	if req.Name != nil {
-		updates["name"] = *req.Name
-	}
-	if req.URL != nil {
-		updates["url"] = *req.URL
-	}
-	if req.Username != nil {
-		updates["username"] = *req.Username
-	}
-	if req.Password != nil {
-		updates["password"] = *req.Password
-	}
-	if req.InsecureSkipTLS != nil {
-		updates["insecure_skip_tls"] = *req.InsecureSkipTLS
-	}
-	if req.CACert != nil {
-		updates["ca_cert"] = *req.CACert
-	}
-	if req.ClientCert != nil {
-		updates["client_cert"] = *req.ClientCert
-	}
-	if req.ClientKey != nil {
-		updates["client_key"] = *req.ClientKey
-	}
-	if req.Headers != nil {
-		updates["headers"] = *req.Headers
-	}
-	if req.Status != nil {
-		updates["status"] = *req.Status
-	}
-
-	if err := h.db.Model(&dataSource).Updates(updates).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update data source")
-		return
-	}
-
-	// Fetch updated data source
-	h.db.Preload("Cluster").First(&dataSource, dataSourceUUID)
-	dataSource.Password = ""
-	dataSource.ClientKey = ""
-
 	respondWithJSON(w, http.StatusOK, dataSource)
 }
 
 // DeleteDataSource deletes a Prometheus data source
 func (h *PrometheusHandler) DeleteDataSource(w http.ResponseWriter, r *http.Request) {
-	// Extract data source ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 5 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID")
-		return
-	}
-
-	dataSourceID := parts[4]
-	dataSourceUUID, err := uuid.Parse(dataSourceID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID format")
-		return
-	}
-
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	dataSourceID, ok := pathUUID(w, r, 4, "data source")
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
-
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
-		return
-	}
-
-	// Fetch data source
-	var dataSource model.PrometheusDataSource
-	if err := h.db.Where("id = ? AND user_id = ?", dataSourceUUID, userUUID).First(&dataSource).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Data source not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch data source")
-		}
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// Delete data source
-	if err := h.db.Delete(&dataSource).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete data source")
+	if err := h.dataSources.Delete(r.Context(), dataSourceID, userID); err != nil {
+		respondWithDataSourceError(w, err, "Failed to delete data source")
 		return
 	}
 
@@ -388,26 +175,36 @@ func (h *PrometheusHandler) TestDataSource(w http.ResponseWriter, r *http.Reques
 		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
 		return
 	}
+	if !model.IsValidDataSourceFlavor(req.Flavor) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "flavor must be prometheus, thanos, victoriametrics, mimir or virtual")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
 
-	startTime := time.Now()
-
-	// TODO: Implement actual Prometheus connection test
-	// This would:
-	// 1. Create HTTP client with TLS config
-	// 2. Query /api/v1/status/buildinfo to get version
-	// 3. Test basic query execution
-
-	duration := time.Since(startTime).Milliseconds()
-
-	// Simulate successful test for now
-	response := model.TestPrometheusDataSourceResponse{
-		Success:  true,
-		Version:  "2.45.0",
-		Message:  "Successfully connected to Prometheus",
-		Duration: duration,
+	if req.Flavor == model.DSFlavorVirtual {
+		userID, ok := requestUserID(w, r)
+		if !ok {
+			return
+		}
+		respondWithJSON(w, http.StatusOK, h.dataSources.TestVirtual(ctx, userID, req.MemberIDs))
+		return
 	}
 
-	respondWithJSON(w, http.StatusOK, response)
+	dataSource := model.PrometheusDataSource{
+		URL:             req.URL,
+		Username:        req.Username,
+		Password:        req.Password,
+		InsecureSkipTLS: req.InsecureSkipTLS,
+		CACert:          req.CACert,
+		ClientCert:      req.ClientCert,
+		ClientKey:       req.ClientKey,
+		Headers:         req.Headers,
+		Flavor:          req.Flavor,
+		TenantID:        req.TenantID,
+		PartialResponse: req.PartialResponse,
+	}
+	respondWithJSON(w, http.StatusOK, service.TestPrometheusConnection(ctx, &dataSource))
 }
 
 // ============== Alert Rule Management ==============
@@ -420,74 +217,14 @@ func (h *PrometheusHandler) CreateAlertRule(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	alertRule, err := h.rules.Create(r.Context(), userID, &req)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
-		return
-	}
-
-	// Verify data source ownership
-	var dataSource model.PrometheusDataSource
-	if err := h.db.Where("id = ? AND user_id = ?", req.DataSourceID, userUUID).First(&dataSource).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Data source not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch data source")
-		}
-		return
-	}
-
-	// Verify cluster ownership if provided
-	if req.ClusterID != nil {
-		var cluster model.K8sCluster
-		if err := h.db.Where("id = ? AND user_id = ?", req.ClusterID, userUUID).First(&cluster).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
-			} else {
-				respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch cluster")
-			}
-			return
-		}
-	}
-
-	// Check if alert rule name already exists
-	var existingRule model.PrometheusAlertRule
-	if err := h.db.Where("data_source_id = ? AND name = ?", req.DataSourceID, req.Name).First(&existingRule).Error; err == nil {
-		respondWithError(w, http.StatusConflict, "CONFLICT", "Alert rule name already exists for this data source")
-		return
-	}
-
-	// Create alert rule
-	alertRule := model.PrometheusAlertRule{
-		UserID:       userUUID,
-		DataSourceID: req.DataSourceID,
-		ClusterID:    req.ClusterID,
-		Name:         req.Name,
-		Expression:   req.Expression,
-		Duration:     req.Duration,
-		Severity:     req.Severity,
-		Summary:      req.Summary,
-		Description:  req.Description,
-		Labels:       req.Labels,
-		Annotations:  req.Annotations,
-		Enabled:      true,
-	}
-
-	if err := h.db.Create(&alertRule).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create alert rule")
+		respondWithDataSourceError(w, err, "Failed to create alert rule")
 		return
 	}
 
@@ -496,70 +233,27 @@ func (h *PrometheusHandler) CreateAlertRule(w http.ResponseWriter, r *http.Reque
 
 // ListAlertRules lists all Prometheus alert rules
 func (h *PrometheusHandler) ListAlertRules(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
-		return
-	}
-
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
 		return
 	}
 
-	// Parse query parameters
-	page := 1
-	pageSize := 20
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
-		}
-	}
-	if pageSizeStr := r.URL.Query().Get("pageSize"); pageSizeStr != "" {
-		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= 100 {
-			pageSize = ps
-		}
-	}
-
-	// Build query
-	query := h.db.Model(&model.PrometheusAlertRule{}).Where("user_id = ?", userUUID)
-
-	// Apply filters
-	if dataSourceID := r.URL.Query().Get("dataSourceId"); dataSourceID != "" {
-		dataSourceUUID, err := uuid.Parse(dataSourceID)
-		if err == nil {
-			query = query.Where("data_source_id = ?", dataSourceUUID)
-		}
-	}
-	if clusterID := r.URL.Query().Get("clusterId"); clusterID != "" {
-		clusterUUID, err := uuid.Parse(clusterID)
-		if err == nil {
-			query = query.Where("cluster_id = ?", clusterUUID)
-		}
-	}
-	if severity := r.URL.Query().Get("severity"); severity != "" {
-		query = query.Where("severity = ?", severity)
+	page, pageSize := pageParams(r)
+	query := r.URL.Query()
+	filter := &db.PrometheusAlertRuleFilter{
+		UserID:       userID,
+		DataSourceID: queryUUID(r, "dataSourceId"),
+		ClusterID:    queryUUID(r, "clusterId"),
+		Severity:     query.Get("severity"),
+		Page:         page,
+		PageSize:     pageSize,
 	}
-	if enabled := r.URL.Query().Get("enabled"); enabled != "" {
-		query = query.Where("enabled = ?", enabled == "true")
+	if enabled := query.Get("enabled"); enabled != "" {
+		on := enabled == "true"
+		filter.Enabled = &on
 	}
-
-	// Count total
-	var total int64
-	query.Count(&total)
-
-	// Fetch alert rules
-	var alertRules []model.PrometheusAlertRule
-	offset := (page - 1) * pageSize
-	if err := query.Preload("DataSource").Preload("Cluster").Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&alertRules).Error; err != nil {
+	alertRules, total, err := h.rules.List(r.Context(), filter)
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch alert rules")
 		return
 	}
@@ -575,47 +269,18 @@ func (h *PrometheusHandler) ListAlertRules(w http.ResponseWriter, r *http.Reques
 
 // GetAlertRule gets a specific alert rule
 func (h *PrometheusHandler) GetAlertRule(w http.ResponseWriter, r *http.Request) {
-	// Extract alert rule ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 5 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid alert rule ID")
-		return
-	}
-
-	alertRuleID := parts[4]
-	alertRuleUUID, err := uuid.Parse(alertRuleID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid alert rule ID format")
-		return
-	}
-
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+	alertRuleID, ok := pathUUID(w, r, 4, "alert rule")
+	if !ok {
 		return
 	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	alertRule, err := h.rules.Get(r.Context(), alertRuleID, userID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
-		return
-	}
-
-	// Fetch alert rule
-	var alertRule model.PrometheusAlertRule
-	if err := h.db.Preload("DataSource").Preload("Cluster").Where("id = ? AND user_id = ?", alertRuleUUID, userUUID).First(&alertRule).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert rule not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch alert rule")
-		}
+		respondWithDataSourceError(w, err, "Failed to fetch alert rule")
 		return
 	}
 
@@ -624,17 +289,8 @@ func (h *PrometheusHandler) GetAlertRule(w http.ResponseWriter, r *http.Request)
 
 // UpdateAlertRule updates an alert rule
 func (h *PrometheusHandler) UpdateAlertRule(w http.ResponseWriter, r *http.Request) {
-	// Extract alert rule ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 5 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid alert rule ID")
-		return
-	}
-
-	alertRuleID := parts[4]
-	alertRuleUUID, err := uuid.Parse(alertRuleID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid alert rule ID format")
+	alertRuleID, ok := pathUUID(w, r, 4, "alert rule")
+	if !ok {
 		return
 	}
 
@@ -644,138 +300,86 @@ func (h *PrometheusHandler) UpdateAlertRule(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
-		return
-	}
-
-	userID, ok := userIDVal.(string)
+	userID, ok := requestUserID(w, r)
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	alertRule, err := h.rules.Update(r.Context(), alertRuleID, userID, &req)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
-		return
-	}
-
-	// Fetch alert rule
-	var alertRule model.PrometheusAlertRule
-	if err := h.db.Where("id = ? AND user_id = ?", alertRuleUUID, userUUID).First(&alertRule).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert rule not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch alert rule")
-		}
+		respondWithDataSourceError(w, err, "Failed to update alert rule")
 		return
 	}
 
-	// Update fields
-	updates := map[string]interface{}{}
-	if req.Name != nil {
-		updates["name"] = *req.Name
-	}
-	if req.Expression != nil {
-		updates["expression"] = *req.Expression
-	}
-	if req.Duration != nil {
-		updates["duration"] = *req.Duration
-	}
-	if req.Severity != nil {
-		updates["severity"] = *req.Severity
-	}
-	if req.Summary != nil {
-		updates["summary"] = *req.Summary
-	}
-	if req.Description != nil {
-		updates["description"] = *req.Description
-	}
-	if req.Labels != nil {
-		updates["labels"] = *req.Labels
-	}
-	if req.Annotations != nil {
-		updates["annotations"] = *req.Annotations
-	}
-	if req.Enabled != nil {
-		updates["enabled"] = *req.Enabled
-	}
-	updates["synced"] = false // Mark as needing sync
-
-	if err := h.db.Model(&alertRule).Updates(updates).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update alert rule")
-		return
-	}
-
-	// Fetch updated alert rule
-	h.db.Preload("DataSource").Preload("Cluster").First(&alertRule, alertRuleUUID)
-
 	respondWithJSON(w, http.StatusOK, alertRule)
 }
 
 // DeleteAlertRule deletes an alert rule
 func (h *PrometheusHandler) DeleteAlertRule(w http.ResponseWriter, r *http.Request) {
-	// Extract alert rule ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 5 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid alert rule ID")
+	alertRuleID, ok := pathUUID(w, r, 4, "alert rule")
+	if !ok {
 		return
 	}
-
-	alertRuleID := parts[4]
-	alertRuleUUID, err := uuid.Parse(alertRuleID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid alert rule ID format")
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+	if err := h.rules.Delete(r.Context(), alertRuleID, userID); err != nil {
+		respondWithDataSourceError(w, err, "Failed to delete alert rule")
 		return
 	}
 
-	userID, ok := userIDVal.(string)
-	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
-		return
-	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Alert rule deleted successfully",
+	})
+}
 
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
+// PreviewAlertRule evaluates an alerting expression against a data source
+// before the rule is saved (POST /api/v1/prometheus/alert-rules/preview)
+func (h *PrometheusHandler) PreviewAlertRule(w http.ResponseWriter, r *http.Request) {
+	var req model.PrometheusAlertRulePreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
 		return
 	}
 
-	// Fetch alert rule
-	var alertRule model.PrometheusAlertRule
-	if err := h.db.Where("id = ? AND user_id = ?", alertRuleUUID, userUUID).First(&alertRule).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert rule not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch alert rule")
-		}
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// Delete alert rule
-	if err := h.db.Delete(&alertRule).Error; err != nil {
-		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete alert rule")
+	preview, err := h.queries.PreviewAlertRule(r.Context(), userID, &req)
+	if err != nil {
+		respondWithQueryError(w, err, "Failed to preview alert rule")
 		return
 	}
+	respondWithJSON(w, http.StatusOK, preview)
+}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"message": "Alert rule deleted successfully",
-	})
+// respondWithDataSourceError sends the status of a data source or alerting rule service error
+func respondWithDataSourceError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPrometheusDataSource):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrPrometheusDataSourceNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Data source not found")
+	case errors.Is(err, service.ErrPrometheusAlertRuleNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert rule not found")
+	case errors.Is(err, service.ErrClusterNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	case errors.Is(err, service.ErrPrometheusDataSourceExists):
+		respondWithError(w, http.StatusConflict, "CONFLICT", "Data source name already exists")
+	case errors.Is(err, service.ErrPrometheusAlertRuleExists):
+		respondWithError(w, http.StatusConflict, "CONFLICT", "Alert rule name already exists for this data source")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
 }
 
 // ============== Query Execution ==============
 
-// ExecuteQuery executes a Prometheus query
+// ExecuteQuery executes a Prometheus query and records it in the query history
 func (h *PrometheusHandler) ExecuteQuery(w http.ResponseWriter, r *http.Request) {
 	var req model.PrometheusQueryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -783,100 +387,41 @@ func (h *PrometheusHandler) ExecuteQuery(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get user ID from context
-	userIDVal := r.Context().Value("user_id")
-	if userIDVal == nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
-
-	userID, ok := userIDVal.(string)
+	dataSourceID, ok := pathUUID(w, r, 4, "data source")
 	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID")
 		return
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	response, err := h.queries.Execute(r.Context(), userID, dataSourceID, &req)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid user ID format")
+		respondWithQueryError(w, err, "Failed to execute query")
 		return
 	}
+	respondWithJSON(w, http.StatusOK, response)
+}
 
-	// Extract data source ID from URL path
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 6 {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID")
+// BuildQuery renders a query built from a common pattern, such as a percentile
+// of a histogram, so it can be reviewed before it is used (POST /api/v1/prometheus/query-builder)
+func (h *PrometheusHandler) BuildQuery(w http.ResponseWriter, r *http.Request) {
+	var req model.PromQLQuery
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
 		return
 	}
-
-	dataSourceID := parts[4]
-	dataSourceUUID, err := uuid.Parse(dataSourceID)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID format")
+	if _, ok := requestUserID(w, r); !ok {
 		return
 	}
 
-	// Verify data source ownership
-	var dataSource model.PrometheusDataSource
-	if err := h.db.Where("id = ? AND user_id = ?", dataSourceUUID, userUUID).First(&dataSource).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Data source not found")
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch data source")
-		}
+	expr, err := service.BuildPromQL(&req)
+	if err != nil {
+		respondWithQueryError(w, err, "Failed to build query")
 		return
 	}
-
-	startTime := time.Now()
-
-	// TODO: Implement actual Prometheus query execution
-	// This would:
-	// 1. Construct HTTP client with data source credentials
-	// 2. Execute query via /api/v1/query or /api/v1/query_range
-	// 3. Parse response and format results
-
-	duration := time.Since(startTime).Milliseconds()
-
-	// Create query record for history
-	queryRecord := model.PrometheusQuery{
-		UserID:       userUUID,
-		DataSourceID: dataSourceUUID,
-		Query:        req.Query,
-		QueryType:    req.QueryType,
-		StartTime:    req.StartTime,
-		EndTime:      req.EndTime,
-		Step:         req.Step,
-		Duration:     duration,
-		Success:      true,
-		ResultCount:  1,
-	}
-	h.db.Create(&queryRecord)
-
-	// Update data source statistics
-	h.db.Model(&dataSource).Updates(map[string]interface{}{
-		"query_count":    dataSource.QueryCount + 1,
-		"last_queried_at": time.Now(),
-	})
-
-	// Simulate query response for now
-	response := model.PrometheusQueryResponse{
-		Status: "success",
-		Data: []model.PrometheusSeries{
-			{
-				Metric: map[string]string{
-					"__name__": "up",
-					"job":      "prometheus",
-					"instance": "localhost:9090",
-				},
-				Values: []model.PrometheusValue{
-					{Timestamp: float64(time.Now().Unix()), Value: "1"},
-				},
-			},
-		},
-		Duration: duration,
-	}
-
-	respondWithJSON(w, http.StatusOK, response)
+	respondWithJSON(w, http.StatusOK, model.PromQLBuildResult{Expr: expr})
 }
 
 // ============== Dashboard Management ==============
@@ -888,6 +433,10 @@ func (h *PrometheusHandler) CreateDashboard(w http.ResponseWriter, r *http.Reque
 		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
 		return
 	}
+	if err := service.ValidateDashboardConfig(req.Config); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
 
 	// Get user ID from context
 	userIDVal := r.Context().Value("user_id")
@@ -921,6 +470,10 @@ func (h *PrometheusHandler) CreateDashboard(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
+	if !enforceQuota(w, userUUID, model.QuotaResourceDashboards, 1) {
+		return
+	}
+
 	// Create dashboard
 	dashboard := model.PrometheusDashboard{
 		UserID:      userUUID,
@@ -1087,6 +640,12 @@ func (h *PrometheusHandler) UpdateDashboard(w http.ResponseWriter, r *http.Reque
 		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
 		return
 	}
+	if req.Config != nil {
+		if err := service.ValidateDashboardConfig(*req.Config); err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+			return
+		}
+	}
 
 	// Get user ID from context
 	userIDVal := r.Context().Value("user_id")
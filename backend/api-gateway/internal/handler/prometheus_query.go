@@ -0,0 +1,287 @@
+// Package handler provides HTTP handlers for Prometheus query history and saved queries
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// ============== Query History ==============
+
+// ListQueryHistory lists the user's past queries, newest first. It takes the
+// dataSourceId, success, queryType, q (a substring of the query), minDuration and
+// maxDuration (milliseconds), since and until filters and page/pageSize.
+func (h *PrometheusHandler) ListQueryHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	filter := model.PrometheusQueryHistoryFilter{
+		QueryType: params.Get("queryType"),
+		Search:    params.Get("q"),
+	}
+	if v := params.Get("dataSourceId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID format")
+			return
+		}
+		filter.DataSourceID = &id
+	}
+	if v := params.Get("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "success must be true or false")
+			return
+		}
+		filter.Success = &success
+	}
+	var err error
+	for name, target := range map[string]*int64{"minDuration": &filter.MinDuration, "maxDuration": &filter.MaxDuration} {
+		if v := params.Get(name); v != "" {
+			if *target, err = strconv.ParseInt(v, 10, 64); err != nil || *target < 0 {
+				respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", name+" must be a number of milliseconds")
+				return
+			}
+		}
+	}
+	if filter.Since, err = parseQueryTime(params.Get("since")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid since time")
+		return
+	}
+	if filter.Until, err = parseQueryTime(params.Get("until")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid until time")
+		return
+	}
+
+	page := 1
+	pageSize := 50
+	if p, err := strconv.Atoi(params.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if ps, err := strconv.Atoi(params.Get("pageSize")); err == nil && ps > 0 && ps <= 500 {
+		pageSize = ps
+	}
+	filter.Limit = pageSize
+	filter.Offset = (page - 1) * pageSize
+
+	entries, total, err := h.queries.History(userID, &filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch query history")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":       entries,
+		"total":      total,
+		"page":       page,
+		"pageSize":   pageSize,
+		"totalPages": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// ClearQueryHistory deletes the user's query history, or that of the data source
+// given as dataSourceId
+func (h *PrometheusHandler) ClearQueryHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var dataSourceID *uuid.UUID
+	if v := r.URL.Query().Get("dataSourceId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID format")
+			return
+		}
+		dataSourceID = &id
+	}
+
+	deleted, err := h.queries.ClearHistory(userID, dataSourceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to clear query history")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"deleted": deleted,
+	})
+}
+
+// ============== Saved Queries ==============
+
+// CreateSavedQuery saves a query, given in full or as the historyId of a past query
+func (h *PrometheusHandler) CreateSavedQuery(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.SavePrometheusQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	saved, err := h.queries.Save(userID, &req)
+	if err != nil {
+		respondWithQueryError(w, err, "Failed to save query")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, saved)
+}
+
+// ListSavedQueries lists the user's saved queries, starred first, optionally
+// filtered by dataSourceId, starred and q
+func (h *PrometheusHandler) ListSavedQueries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	var dataSourceID *uuid.UUID
+	if v := params.Get("dataSourceId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID format")
+			return
+		}
+		dataSourceID = &id
+	}
+	var starred *bool
+	if v := params.Get("starred"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "starred must be true or false")
+			return
+		}
+		starred = &b
+	}
+
+	saved, err := h.queries.ListSaved(userID, dataSourceID, starred, params.Get("q"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch saved queries")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  saved,
+		"total": len(saved),
+	})
+}
+
+// GetSavedQuery gets a saved query
+func (h *PrometheusHandler) GetSavedQuery(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "saved query")
+	if !ok {
+		return
+	}
+
+	saved, err := h.queries.GetSaved(userID, id)
+	if err != nil {
+		respondWithQueryError(w, err, "Failed to fetch saved query")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, saved)
+}
+
+// UpdateSavedQuery changes a saved query, including starring or unstarring it
+func (h *PrometheusHandler) UpdateSavedQuery(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "saved query")
+	if !ok {
+		return
+	}
+
+	var req model.UpdatePrometheusSavedQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	saved, err := h.queries.UpdateSaved(userID, id, &req)
+	if err != nil {
+		respondWithQueryError(w, err, "Failed to update saved query")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, saved)
+}
+
+// DeleteSavedQuery deletes a saved query
+func (h *PrometheusHandler) DeleteSavedQuery(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "saved query")
+	if !ok {
+		return
+	}
+
+	if err := h.queries.DeleteSaved(userID, id); err != nil {
+		respondWithQueryError(w, err, "Failed to delete saved query")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Saved query deleted successfully",
+	})
+}
+
+// RunSavedQuery runs a saved query, over the startTime, endTime and step of the
+// request body when given
+func (h *PrometheusHandler) RunSavedQuery(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "saved query")
+	if !ok {
+		return
+	}
+
+	var req model.RunPrometheusSavedQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	response, err := h.queries.RunSaved(r.Context(), userID, id, &req)
+	if err != nil {
+		respondWithQueryError(w, err, "Failed to run saved query")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// respondWithQueryError maps Prometheus query service errors to responses
+func respondWithQueryError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPrometheusQuery):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrPrometheusDataSourceNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Data source not found")
+	case errors.Is(err, service.ErrSavedQueryNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Saved query not found")
+	case errors.Is(err, service.ErrQueryHistoryNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Query history entry not found")
+	case errors.Is(err, service.ErrPrometheusQueryFailed):
+		respondWithError(w, http.StatusBadGateway, "QUERY_FAILED", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
@@ -0,0 +1,199 @@
+// Package handler provides HTTP handlers for usage and quotas
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// quotas enforces usage quotas when resources are created; quotas are not enforced
+// until it is registered
+var quotas *service.QuotaService
+
+// RegisterQuotaService makes resource creation enforce usage quotas
+func RegisterQuotaService(q *service.QuotaService) {
+	quotas = q
+}
+
+// enforceQuota checks that the user may add more of resource, sending an error
+// response and returning false if not
+func enforceQuota(w http.ResponseWriter, userID uuid.UUID, resource string, adding int64) bool {
+	_, ok := checkQuota(w, userID, resource, adding)
+	return ok
+}
+
+// checkQuota is enforceQuota that also returns the warning of an exceeded soft
+// quota, which lets the action go ahead and is set as the X-Quota-Warning header.
+// Running out of LLM tokens is 403, of staged file storage 413; having no room
+// for another resource is 409.
+func checkQuota(w http.ResponseWriter, userID uuid.UUID, resource string, adding int64) (string, bool) {
+	if quotas == nil {
+		return "", true
+	}
+	err := quotas.Check(userID, resource, adding)
+	if err == nil {
+		return "", true
+	}
+
+	var exceeded *service.QuotaExceededError
+	if !errors.As(err, &exceeded) {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to check quota")
+		return "", false
+	}
+	if exceeded.Soft {
+		w.Header().Set("X-Quota-Warning", exceeded.Error())
+		return exceeded.Error(), true
+	}
+	status, code := http.StatusConflict, "QUOTA_EXCEEDED"
+	switch resource {
+	case model.QuotaResourceLLMTokens:
+		status, code = http.StatusForbidden, "TOKEN_QUOTA_EXCEEDED"
+	case model.QuotaResourceStagedBytes:
+		status, code = http.StatusRequestEntityTooLarge, "STORAGE_QUOTA_EXCEEDED"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": exceeded.Error(),
+			"details": map[string]interface{}{
+				"resource": exceeded.Resource,
+				"scope":    exceeded.Scope,
+				"subject":  exceeded.Subject,
+				"limit":    exceeded.Limit,
+				"used":     exceeded.Used,
+			},
+		},
+		"requestId": responseRequestID(w),
+	})
+	return "", false
+}
+
+// QuotaHandler handles usage reports and quota management
+type QuotaHandler struct {
+	db     *gorm.DB
+	quotas *service.QuotaService
+}
+
+// NewQuotaHandler creates a new quota handler
+func NewQuotaHandler(db *gorm.DB, quotas *service.QuotaService) *QuotaHandler {
+	return &QuotaHandler{db: db, quotas: quotas}
+}
+
+// GetUsageSummary returns what every user and org consumes
+func (h *QuotaHandler) GetUsageSummary(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "users", "list", nil, "") {
+		return
+	}
+
+	summary, err := h.quotas.Summary()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to summarize usage")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, summary)
+}
+
+// GetMyUsage returns what the caller consumes against their limits
+func (h *QuotaHandler) GetMyUsage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	usage, err := h.quotas.UserUsage(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get usage")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, usage)
+}
+
+// ListQuotas lists quotas, filtered by the scope query parameter
+func (h *QuotaHandler) ListQuotas(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "users", "list", nil, "") {
+		return
+	}
+
+	list, err := h.quotas.ListQuotas(r.URL.Query().Get("scope"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list quotas")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  list,
+		"total": len(list),
+	})
+}
+
+// SetQuota creates or updates a quota
+func (h *QuotaHandler) SetQuota(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "users", "manage", nil, "") {
+		return
+	}
+
+	var req model.SetQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	quota, err := h.quotas.SetQuota(&req, userID)
+	if errors.Is(err, service.ErrInvalidQuota) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to set quota")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, quota)
+}
+
+// DeleteQuota removes a quota
+func (h *QuotaHandler) DeleteQuota(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "users", "manage", nil, "") {
+		return
+	}
+
+	// /api/v1/quotas/{id}
+	id, ok := pathUUID(w, r, 3, "quota")
+	if !ok {
+		return
+	}
+	if err := h.quotas.DeleteQuota(id); errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Quota not found")
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete quota")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Quota deleted successfully",
+	})
+}
@@ -8,13 +8,15 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
 	"gorm.io/gorm"
 	"myops.k8s.io/backend/pkg/model"
 )
 
 // RBACHandler handles RBAC operations
 type RBACHandler struct {
-	db *gorm.DB
+	db    *gorm.DB
+	flags *service.FeatureFlagService
 }
 
 // NewRBACHandler creates a new RBAC handler
@@ -22,6 +24,11 @@ func NewRBACHandler(db *gorm.DB) *RBACHandler {
 	return &RBACHandler{db: db}
 }
 
+// SetFeatureFlags sets the flags reported to the current user
+func (h *RBACHandler) SetFeatureFlags(flags *service.FeatureFlagService) {
+	h.flags = flags
+}
+
 // Permission Requests/Responses
 
 type ListPermissionsRequest struct {
@@ -81,6 +88,7 @@ type AssignUserRoleRequest struct {
 	RoleID       uuid.UUID  `json:"roleId" binding:"required"`
 	ResourceID   *uuid.UUID `json:"resourceId"`
 	ResourceType string     `json:"resourceType" binding:"omitempty,oneof=cluster namespace host"`
+	Namespace    string     `json:"namespace"` // With a cluster resource, limits the role to this namespace
 	ExpiresAt    *time.Time `json:"expiresAt"`
 }
 
@@ -89,10 +97,22 @@ type RemoveUserRoleRequest struct {
 }
 
 type CheckPermissionRequest struct {
-	Resource     string     `json:"resource" binding:"required"`
-	Action       string     `json:"action" binding:"required"`
-	ResourceID   *uuid.UUID `json:"resourceId"`
-	ResourceType string     `json:"resourceType"`
+	Resource     string            `json:"resource" binding:"required"`
+	Action       string            `json:"action" binding:"required"`
+	ResourceID   *uuid.UUID        `json:"resourceId"`
+	ResourceType string            `json:"resourceType"`
+	Namespace    string            `json:"namespace"` // Checks in a namespace of the cluster in resourceId
+	Labels       map[string]string `json:"labels"`    // Checks against a Kubernetes object with these labels
+}
+
+// target returns what the permission is checked against
+func (req CheckPermissionRequest) target() model.PermissionTarget {
+	target := model.PermissionTarget{ResourceID: req.ResourceID, ResourceType: req.ResourceType, Labels: req.Labels}
+	if req.ResourceType == "cluster" {
+		target.ClusterID = req.ResourceID
+		target.Namespace = req.Namespace
+	}
+	return target
 }
 
 // Resource Access Policy Requests/Responses
@@ -462,8 +482,13 @@ func (h *RBACHandler) DeleteRole(c *gin.Context) {
 	}
 
 	// Delete role permissions and role
-	h.db.Where("role_id = ?", roleID).Delete(&model.RolePermission{})
-	if err := h.db.Delete(&role).Error; err != nil {
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", roleID).Delete(&model.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -510,22 +535,38 @@ func (h *RBACHandler) AssignRolePermissions(c *gin.Context) {
 		return
 	}
 
-	// If override is true, remove existing permissions
-	if req.Override {
-		h.db.Where("role_id = ?", roleID).Delete(&model.RolePermission{})
-	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// If override is true, remove existing permissions
+		if req.Override {
+			if err := tx.Where("role_id = ?", roleID).Delete(&model.RolePermission{}).Error; err != nil {
+				return err
+			}
+		}
 
-	// Assign new permissions
-	for _, permID := range req.PermissionIDs {
-		// Check if already assigned
-		var existing model.RolePermission
-		if err := h.db.Where("role_id = ? AND permission_id = ?", roleID, permID).First(&existing).Error; err == gorm.ErrRecordNotFound {
+		// Assign new permissions
+		for _, permID := range req.PermissionIDs {
+			// Check if already assigned
+			var existing model.RolePermission
+			err := tx.Where("role_id = ? AND permission_id = ?", roleID, permID).First(&existing).Error
+			if err == nil {
+				continue
+			}
+			if err != gorm.ErrRecordNotFound {
+				return err
+			}
 			rolePerm := model.RolePermission{
 				RoleID:       roleID,
 				PermissionID: permID,
 			}
-			h.db.Create(&rolePerm)
+			if err := tx.Create(&rolePerm).Error; err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Permissions assigned successfully", "count": len(req.PermissionIDs)})
@@ -610,8 +651,8 @@ func (h *RBACHandler) AssignUserRole(c *gin.Context) {
 
 	// Check for duplicate assignment
 	var existing model.UserRole
-	err = h.db.Where("user_id = ? AND role_id = ? AND resource_id = ? AND resource_type = ?",
-		userUUID, req.RoleID, req.ResourceID, req.ResourceType).First(&existing).Error
+	err = h.db.Where("user_id = ? AND role_id = ? AND resource_id = ? AND resource_type = ? AND namespace = ?",
+		userUUID, req.RoleID, req.ResourceID, req.ResourceType, req.Namespace).First(&existing).Error
 	if err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Role already assigned to user"})
 		return
@@ -622,6 +663,7 @@ func (h *RBACHandler) AssignUserRole(c *gin.Context) {
 		RoleID:       req.RoleID,
 		ResourceID:   req.ResourceID,
 		ResourceType: req.ResourceType,
+		Namespace:    req.Namespace,
 		ExpiresAt:    req.ExpiresAt,
 	}
 
@@ -699,7 +741,7 @@ func (h *RBACHandler) CheckPermission(c *gin.Context) {
 		return
 	}
 
-	result := model.UserHasPermission(h.db, userUUID, req.Resource, req.Action, req.ResourceID, req.ResourceType)
+	result := model.CheckPermission(h.db, userUUID, req.Resource, req.Action, req.target())
 
 	c.JSON(http.StatusOK, gin.H{
 		"allowed": result.Allowed,
@@ -727,6 +769,10 @@ func (h *RBACHandler) CreateResourceAccessPolicy(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if _, err := model.ParsePolicySelector(req.Selector); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid selector: " + err.Error()})
+		return
+	}
 
 	policy := model.ResourceAccessPolicy{
 		Name:        req.Name,
@@ -781,6 +827,10 @@ func (h *RBACHandler) UpdateResourceAccessPolicy(c *gin.Context) {
 		updates["resource"] = *req.Resource
 	}
 	if req.Selector != nil {
+		if _, err := model.ParsePolicySelector(*req.Selector); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid selector: " + err.Error()})
+			return
+		}
 		updates["selector"] = *req.Selector
 	}
 	if req.Enabled != nil {
@@ -891,6 +941,7 @@ func (h *RBACHandler) GetCurrentUser(c *gin.Context) {
 		"roles":       user.Roles,
 		"permissions": permissions,
 		"permissionsMap": permissionsMap,
+		"features":    h.flags.Evaluate(userID),
 	})
 }
 
@@ -913,9 +964,16 @@ func (h *RBACHandler) BatchCheckPermissions(c *gin.Context) {
 		return
 	}
 
+	// Every check runs against the same compiled set
+	set, err := model.CachedPermissionSet(h.db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	results := make([]gin.H, len(req.Checks))
 	for i, check := range req.Checks {
-		result := model.UserHasPermission(h.db, userID, check.Resource, check.Action, check.ResourceID, check.ResourceType)
+		result := set.Check(check.Resource, check.Action, check.target())
 		results[i] = gin.H{
 			"resource": check.Resource,
 			"action":   check.Action,
@@ -50,6 +50,6 @@ func (h *RefreshTokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"data":      resp,
-		"requestId": generateRequestID(),
+		"requestId": responseRequestID(w),
 	})
 }
@@ -49,6 +49,6 @@ func (h *RegisterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"data":      resp,
-		"requestId": generateRequestID(),
+		"requestId": responseRequestID(w),
 	})
 }
@@ -0,0 +1,190 @@
+// Package handler provides HTTP handlers for remote_write targets
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// RemoteWriteHandler handles the remote_write targets agent metrics are pushed to
+type RemoteWriteHandler struct {
+	db          *gorm.DB
+	remoteWrite *service.RemoteWriteService
+}
+
+// NewRemoteWriteHandler creates a new remote write handler
+func NewRemoteWriteHandler(db *gorm.DB, remoteWrite *service.RemoteWriteService) *RemoteWriteHandler {
+	return &RemoteWriteHandler{db: db, remoteWrite: remoteWrite}
+}
+
+// ListTargets lists the remote_write targets with their delivery status
+func (h *RemoteWriteHandler) ListTargets(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "view", nil, "") {
+		return
+	}
+
+	targets, err := h.remoteWrite.List()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch remote write targets")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  targets,
+		"total": len(targets),
+	})
+}
+
+// CreateTarget adds a remote_write target
+func (h *RemoteWriteHandler) CreateTarget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "manage", nil, "") {
+		return
+	}
+
+	var req model.CreateRemoteWriteTargetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	target, err := h.remoteWrite.Create(userID, &req)
+	if err != nil {
+		respondWithRemoteWriteError(w, err, "Failed to create remote write target")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, target)
+}
+
+// GetTarget gets a remote_write target
+func (h *RemoteWriteHandler) GetTarget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "view", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "remote write target")
+	if !ok {
+		return
+	}
+
+	target, err := h.remoteWrite.Get(id)
+	if err != nil {
+		respondWithRemoteWriteError(w, err, "Failed to fetch remote write target")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, target)
+}
+
+// UpdateTarget changes a remote_write target
+func (h *RemoteWriteHandler) UpdateTarget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "remote write target")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateRemoteWriteTargetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	target, err := h.remoteWrite.Update(id, &req)
+	if err != nil {
+		respondWithRemoteWriteError(w, err, "Failed to update remote write target")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, target)
+}
+
+// DeleteTarget removes a remote_write target
+func (h *RemoteWriteHandler) DeleteTarget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "remote write target")
+	if !ok {
+		return
+	}
+
+	if err := h.remoteWrite.Delete(id); err != nil {
+		respondWithRemoteWriteError(w, err, "Failed to delete remote write target")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Remote write target deleted successfully",
+	})
+}
+
+// TestTarget sends a test sample to a remote_write target
+func (h *RemoteWriteHandler) TestTarget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "remote write target")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+	start := time.Now()
+	err := h.remoteWrite.Test(ctx, id)
+	if errors.Is(err, service.ErrRemoteWriteTargetNotFound) || errors.Is(err, service.ErrInvalidRemoteWriteTarget) {
+		respondWithRemoteWriteError(w, err, "Failed to test remote write target")
+		return
+	}
+
+	result := map[string]interface{}{
+		"success":      err == nil,
+		"responseTime": time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result["message"] = err.Error()
+	} else {
+		result["message"] = "Test sample accepted"
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// respondWithRemoteWriteError maps remote write service errors to responses
+func respondWithRemoteWriteError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidRemoteWriteTarget):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrRemoteWriteTargetNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Remote write target not found")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
@@ -0,0 +1,350 @@
+// Package handler provides HTTP handlers for scheduled reports and the report archive
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// ReportHandler handles report templates, schedules and generated reports
+type ReportHandler struct {
+	db      *gorm.DB
+	reports *service.ReportService
+}
+
+// NewReportHandler creates a new report handler
+func NewReportHandler(db *gorm.DB, reports *service.ReportService) *ReportHandler {
+	return &ReportHandler{db: db, reports: reports}
+}
+
+// ListTemplates lists the templates reports are generated from
+func (h *ReportHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "view", nil, "") {
+		return
+	}
+
+	templates := h.reports.Templates()
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  templates,
+		"total": len(templates),
+	})
+}
+
+// GenerateReport queues a report covering the window before now; it is
+// delivered to the recipients once generated (POST /api/v1/reports)
+func (h *ReportHandler) GenerateReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "manage", nil, "") {
+		return
+	}
+
+	var req model.GenerateReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	report, err := h.reports.Generate(userID, &req)
+	if err != nil {
+		respondWithReportError(w, err, "Failed to queue report")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, report)
+}
+
+// ListReports lists archived reports with optional scheduleId, status, since
+// and until filters and page/pageSize
+func (h *ReportHandler) ListReports(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "view", nil, "") {
+		return
+	}
+
+	params := r.URL.Query()
+	filter := model.ReportFilter{
+		ScheduleID: queryUUID(r, "scheduleId"),
+		Status:     model.ReportStatus(params.Get("status")),
+	}
+	var err error
+	if filter.Since, err = parseQueryTime(params.Get("since")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid since time")
+		return
+	}
+	if filter.Until, err = parseQueryTime(params.Get("until")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid until time")
+		return
+	}
+	page, pageSize := pageParams(r)
+	filter.Limit = pageSize
+	filter.Offset = (page - 1) * pageSize
+
+	reports, total, err := h.reports.Reports(&filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch reports")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":     reports,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// GetReport gets an archived report with its data (GET /api/v1/reports/{id})
+func (h *ReportHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "view", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "report")
+	if !ok {
+		return
+	}
+
+	report, err := h.reports.Report(id)
+	if err != nil {
+		respondWithReportError(w, err, "Failed to fetch report")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// DownloadReport downloads a generated report in its format, or in ?format=pdf
+// or csv (GET /api/v1/reports/{id}/download)
+func (h *ReportHandler) DownloadReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "view", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "report")
+	if !ok {
+		return
+	}
+
+	report, err := h.reports.Report(id)
+	if err != nil {
+		respondWithReportError(w, err, "Failed to fetch report")
+		return
+	}
+	format := report.Format
+	if f := r.URL.Query().Get("format"); f != "" {
+		format = model.ReportFormat(f)
+	}
+	data, err := service.ExportReport(report, format)
+	if err != nil {
+		respondWithReportError(w, err, "Failed to export report")
+		return
+	}
+
+	contentType := "application/pdf"
+	if format == model.ReportFormatCSV {
+		contentType = "text/csv"
+	}
+	filename := fmt.Sprintf("%s-%s.%s", report.Template, report.PeriodEnd.Format("20060102-150405"), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// DeleteReport removes a report from the archive (DELETE /api/v1/reports/{id})
+func (h *ReportHandler) DeleteReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "report")
+	if !ok {
+		return
+	}
+
+	if err := h.reports.DeleteReport(id); err != nil {
+		respondWithReportError(w, err, "Failed to delete report")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Report deleted successfully",
+	})
+}
+
+// ListSchedules lists the report schedules
+func (h *ReportHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "view", nil, "") {
+		return
+	}
+
+	schedules, err := h.reports.ListSchedules()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch report schedules")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  schedules,
+		"total": len(schedules),
+	})
+}
+
+// CreateSchedule adds a schedule that generates a report on a cron schedule
+func (h *ReportHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "manage", nil, "") {
+		return
+	}
+
+	var req model.CreateReportScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	schedule, err := h.reports.CreateSchedule(userID, &req)
+	if err != nil {
+		respondWithReportError(w, err, "Failed to create report schedule")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, schedule)
+}
+
+// GetSchedule gets a report schedule
+func (h *ReportHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "view", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "report schedule")
+	if !ok {
+		return
+	}
+
+	schedule, err := h.reports.GetSchedule(id)
+	if err != nil {
+		respondWithReportError(w, err, "Failed to fetch report schedule")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, schedule)
+}
+
+// UpdateSchedule changes a report schedule
+func (h *ReportHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "report schedule")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateReportScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	schedule, err := h.reports.UpdateSchedule(id, &req)
+	if err != nil {
+		respondWithReportError(w, err, "Failed to update report schedule")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, schedule)
+}
+
+// DeleteSchedule removes a report schedule
+func (h *ReportHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "report schedule")
+	if !ok {
+		return
+	}
+
+	if err := h.reports.DeleteSchedule(id); err != nil {
+		respondWithReportError(w, err, "Failed to delete report schedule")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Report schedule deleted successfully",
+	})
+}
+
+// RunSchedule queues a report of a schedule now (POST /api/v1/reports/schedules/{id}/run)
+func (h *ReportHandler) RunSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "reports", "manage", nil, "") {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "report schedule")
+	if !ok {
+		return
+	}
+
+	report, err := h.reports.RunSchedule(userID, id)
+	if err != nil {
+		respondWithReportError(w, err, "Failed to queue report")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, report)
+}
+
+// respondWithReportError maps report service errors to responses
+func respondWithReportError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidReport):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrReportNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Report not found")
+	case errors.Is(err, service.ErrReportScheduleNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Report schedule not found")
+	case errors.Is(err, service.ErrReportNotReady):
+		respondWithError(w, http.StatusConflict, "REPORT_NOT_READY", "Report has not been generated")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
@@ -0,0 +1,295 @@
+// Package handler provides the websocket watch of the pods, deployments and
+// events of a namespace
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// Resource watch settings
+const (
+	resourceWatchBuffer       = 256
+	resourceWatchWriteTimeout = 10 * time.Second
+)
+
+// resourceWatchPermissions are the namespace permissions needed to watch each kind
+var resourceWatchPermissions = map[k8s.WatchKind]struct{ resource, action string }{
+	k8s.WatchPods:        {"pods", "list"},
+	k8s.WatchDeployments: {"workloads", "list"},
+	k8s.WatchEvents:      {"workloads", "list"},
+}
+
+// ResourceWatchMessage is a message sent to or received from a resource watch
+// client. Clients send "subscribe" messages; the server sends "subscribed",
+// "resync", "delta", "synced" and "error" messages.
+//
+// After "subscribed" the server either replays the deltas since the requested
+// resourceVersion or sends "resync", telling the client to drop what it holds,
+// followed by the current objects as added deltas. "synced" ends either with
+// the version to resume from; live deltas follow. Deltas are upserts keyed by
+// kind and name, and a replay may repeat the last delta the client received.
+type ResourceWatchMessage struct {
+	Type            string          `json:"type"`
+	Kinds           []k8s.WatchKind `json:"kinds,omitempty"`
+	Denied          []k8s.WatchKind `json:"denied,omitempty"` // Requested kinds the user may not watch
+	LabelSelector   string          `json:"labelSelector,omitempty"`
+	Name            string          `json:"name,omitempty"` // Only objects of this name, or events about them
+	ResourceVersion string          `json:"resourceVersion,omitempty"`
+	Resumed         bool            `json:"resumed,omitempty"`
+	Delta           *k8s.WatchDelta `json:"delta,omitempty"`
+	Message         string          `json:"message,omitempty"`
+}
+
+// resourceWatchSubscription is what a client currently watches
+type resourceWatchSubscription struct {
+	kinds  []k8s.WatchKind
+	filter *k8s.WatchFilter
+	watch  *service.ResourceWatch
+	last   string // Resource version of the last delta seen
+}
+
+func (s *resourceWatchSubscription) deltas() <-chan k8s.WatchDelta {
+	if s.watch == nil {
+		return nil
+	}
+	return s.watch.Deltas()
+}
+
+func (s *resourceWatchSubscription) close() {
+	if s.watch != nil {
+		s.watch.Close()
+		s.watch = nil
+	}
+}
+
+// ResourceWatchHandler streams the changes to the pods, deployments and events
+// of a namespace over a websocket
+type ResourceWatchHandler struct {
+	db      *gorm.DB
+	watches *service.ResourceWatchService
+}
+
+// NewResourceWatchHandler creates a new resource watch handler
+func NewResourceWatchHandler(db *gorm.DB, watches *service.ResourceWatchService) *ResourceWatchHandler {
+	return &ResourceWatchHandler{db: db, watches: watches}
+}
+
+// ServeHTTP upgrades the connection and streams the namespace's changes. The
+// cluster and namespace are taken from the clusterId and namespace query
+// parameters. The initial subscription is taken from kinds (comma separated),
+// labelSelector, name and resourceVersion, and can be replaced at any time
+// with a subscribe message.
+func (h *ResourceWatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, userID, ok := authenticateWebSocket(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	clusterID, err := uuid.Parse(query.Get("clusterId"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid cluster ID")
+		return
+	}
+	namespace := query.Get("namespace")
+	if namespace == "" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "namespace is required")
+		return
+	}
+
+	initial := ResourceWatchMessage{
+		Type:            "subscribe",
+		LabelSelector:   query.Get("labelSelector"),
+		Name:            query.Get("name"),
+		ResourceVersion: query.Get("resourceVersion"),
+	}
+	for _, kind := range strings.Split(query.Get("kinds"), ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			initial.Kinds = append(initial.Kinds, k8s.WatchKind(kind))
+		}
+	}
+	if _, err := k8s.NewWatchFilter(initial.LabelSelector, initial.Name); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid label selector")
+		return
+	}
+
+	var cluster model.K8sCluster
+	if err := h.db.Where("id = ?", clusterID).First(&cluster).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+		return
+	}
+	if allowed, _ := h.allowedKinds(userID, &cluster, namespace, k8s.WatchKinds); len(allowed) == 0 {
+		respondWithError(w, http.StatusForbidden, "PERMISSION_DENIED", "Permission to list workloads required in namespace "+namespace)
+		return
+	}
+
+	conn, err := upgradeWebSocket(w, r, userID)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// The reader forwards subscription changes to the writer, which owns the connection
+	requests := make(chan ResourceWatchMessage, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var msg ResourceWatchMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			select {
+			case requests <- msg:
+			case <-time.After(resourceWatchWriteTimeout):
+			}
+		}
+	}()
+
+	ctx := r.Context()
+	current := &resourceWatchSubscription{}
+	defer current.close()
+	if !h.subscribe(ctx, conn, userID, &cluster, namespace, current, initial) {
+		return
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case msg := <-requests:
+			if msg.Type != "subscribe" {
+				if !writeResourceWatchMessage(conn, ResourceWatchMessage{Type: "error", Message: "unknown message type " + msg.Type}) {
+					return
+				}
+				continue
+			}
+			if !h.subscribe(ctx, conn, userID, &cluster, namespace, current, msg) {
+				return
+			}
+		case delta, ok := <-current.deltas():
+			if !ok {
+				// A client that fell behind picks up from the last delta seen
+				if !current.watch.Overflowed() {
+					writeResourceWatchMessage(conn, ResourceWatchMessage{Type: "error", Message: "watch stopped"})
+					return
+				}
+				current.close()
+				if !h.start(ctx, conn, cluster.ID, namespace, current, current.last) {
+					return
+				}
+				continue
+			}
+			current.last = delta.ResourceVersion
+			if !current.filter.Matches(&delta) {
+				continue
+			}
+			if !writeResourceWatchMessage(conn, ResourceWatchMessage{Type: "delta", Delta: &delta}) {
+				return
+			}
+		}
+	}
+}
+
+// subscribe replaces the client's subscription with the requested kinds the
+// user may watch, acknowledges it and starts the watch. No kinds means every
+// kind.
+func (h *ResourceWatchHandler) subscribe(ctx context.Context, conn *wsConn, userID uuid.UUID, cluster *model.K8sCluster, namespace string, current *resourceWatchSubscription, req ResourceWatchMessage) bool {
+	requested := req.Kinds
+	if len(requested) == 0 {
+		requested = k8s.WatchKinds
+	}
+	for _, kind := range requested {
+		if _, ok := resourceWatchPermissions[kind]; !ok {
+			return writeResourceWatchMessage(conn, ResourceWatchMessage{Type: "error", Message: "unknown kind " + string(kind)})
+		}
+	}
+	filter, err := k8s.NewWatchFilter(req.LabelSelector, req.Name)
+	if err != nil {
+		return writeResourceWatchMessage(conn, ResourceWatchMessage{Type: "error", Message: err.Error()})
+	}
+
+	allowed, denied := h.allowedKinds(userID, cluster, namespace, requested)
+	current.close()
+	current.kinds = allowed
+	current.filter = filter
+	current.last = ""
+
+	ack := ResourceWatchMessage{
+		Type:          "subscribed",
+		Kinds:         append([]k8s.WatchKind{}, allowed...),
+		Denied:        denied,
+		LabelSelector: req.LabelSelector,
+		Name:          req.Name,
+	}
+	if !writeResourceWatchMessage(conn, ack) {
+		return false
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	return h.start(ctx, conn, cluster.ID, namespace, current, req.ResourceVersion)
+}
+
+// start watches the client's kinds from resourceVersion and sends what the
+// watch begins with
+func (h *ResourceWatchHandler) start(ctx context.Context, conn *wsConn, clusterID uuid.UUID, namespace string, current *resourceWatchSubscription, resourceVersion string) bool {
+	watch, err := h.watches.Watch(ctx, clusterID, namespace, current.kinds, resourceVersion, resourceWatchBuffer)
+	if err != nil {
+		writeResourceWatchMessage(conn, ResourceWatchMessage{Type: "error", Message: "Failed to watch namespace: " + err.Error()})
+		return false
+	}
+	current.watch = watch
+	current.last = watch.ResourceVersion
+
+	if !watch.Resumed && !writeResourceWatchMessage(conn, ResourceWatchMessage{Type: "resync"}) {
+		return false
+	}
+	for i := range watch.Initial {
+		delta := &watch.Initial[i]
+		if !current.filter.Matches(delta) {
+			continue
+		}
+		if !writeResourceWatchMessage(conn, ResourceWatchMessage{Type: "delta", Delta: delta}) {
+			return false
+		}
+	}
+	return writeResourceWatchMessage(conn, ResourceWatchMessage{
+		Type:            "synced",
+		ResourceVersion: watch.ResourceVersion,
+		Resumed:         watch.Resumed,
+	})
+}
+
+// allowedKinds splits kinds into those the user may watch in namespace and
+// the rest. Cluster owners may watch every kind.
+func (h *ResourceWatchHandler) allowedKinds(userID uuid.UUID, cluster *model.K8sCluster, namespace string, kinds []k8s.WatchKind) (allowed, denied []k8s.WatchKind) {
+	for _, kind := range kinds {
+		permission := resourceWatchPermissions[kind]
+		if cluster.UserID == userID || model.UserHasNamespacePermission(h.db, userID, permission.resource, permission.action, cluster.ID, namespace).Allowed {
+			allowed = append(allowed, kind)
+		} else {
+			denied = append(denied, kind)
+		}
+	}
+	return allowed, denied
+}
+
+func writeResourceWatchMessage(conn *wsConn, msg ResourceWatchMessage) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return true
+	}
+	return conn.WriteMessage(websocket.TextMessage, data) == nil
+}
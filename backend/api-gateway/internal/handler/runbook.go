@@ -0,0 +1,197 @@
+// Package handler provides HTTP handlers for alert rule runbooks
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// RunbookHandler handles runbook operations
+type RunbookHandler struct {
+	db       *gorm.DB
+	runbooks *service.RunbookService
+}
+
+// NewRunbookHandler creates a new runbook handler
+func NewRunbookHandler(db *gorm.DB, runbooks *service.RunbookService) *RunbookHandler {
+	return &RunbookHandler{db: db, runbooks: runbooks}
+}
+
+// ListRunbooks lists the runbooks of an alert rule (GET /api/v1/alert-rules/{id}/runbooks)
+func (h *RunbookHandler) ListRunbooks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	ruleID, ok := pathUUID(w, r, 3, "rule")
+	if !ok {
+		return
+	}
+
+	runbooks, err := h.runbooks.List(userID, ruleID)
+	if err != nil {
+		respondWithRunbookError(w, err, "Failed to list runbooks")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  runbooks,
+		"total": len(runbooks),
+	})
+}
+
+// CreateRunbook attaches a runbook to an alert rule (POST /api/v1/alert-rules/{id}/runbooks)
+func (h *RunbookHandler) CreateRunbook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	ruleID, ok := pathUUID(w, r, 3, "rule")
+	if !ok {
+		return
+	}
+
+	var req model.CreateRunbookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	runbook, err := h.runbooks.Create(userID, ruleID, &req)
+	if err != nil {
+		respondWithRunbookError(w, err, "Failed to create runbook")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, runbook)
+}
+
+// GetRunbook gets a runbook (GET /api/v1/runbooks/{id})
+func (h *RunbookHandler) GetRunbook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "runbook")
+	if !ok {
+		return
+	}
+
+	runbook, err := h.runbooks.Get(userID, id)
+	if err != nil {
+		respondWithRunbookError(w, err, "Failed to fetch runbook")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, runbook)
+}
+
+// UpdateRunbook changes a runbook (PUT /api/v1/runbooks/{id})
+func (h *RunbookHandler) UpdateRunbook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "runbook")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateRunbookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	runbook, err := h.runbooks.Update(userID, id, &req)
+	if err != nil {
+		respondWithRunbookError(w, err, "Failed to update runbook")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, runbook)
+}
+
+// DeleteRunbook removes a runbook and its history (DELETE /api/v1/runbooks/{id})
+func (h *RunbookHandler) DeleteRunbook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "runbook")
+	if !ok {
+		return
+	}
+
+	if err := h.runbooks.Delete(userID, id); err != nil {
+		respondWithRunbookError(w, err, "Failed to delete runbook")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Runbook deleted successfully",
+	})
+}
+
+// ExecuteRunbook runs a runbook for a firing alert of its rule
+// (POST /api/v1/runbooks/{id}/execute). The run continues in the background.
+func (h *RunbookHandler) ExecuteRunbook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "runbook")
+	if !ok {
+		return
+	}
+
+	var req model.ExecuteRunbookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	execution, err := h.runbooks.Execute(userID, id, req.AlertID)
+	if err != nil {
+		respondWithRunbookError(w, err, "Failed to execute runbook")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, execution)
+}
+
+// ListExecutions lists runbook executions, newest first, optionally those of
+// ?runbookId or ?alertId (GET /api/v1/runbook-executions)
+func (h *RunbookHandler) ListExecutions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	page, pageSize := pageParams(r)
+	executions, total, err := h.runbooks.Executions(userID, queryUUID(r, "runbookId"), queryUUID(r, "alertId"), page, pageSize)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list runbook executions")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":     executions,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+func respondWithRunbookError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrRunbookNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Runbook not found")
+	case errors.Is(err, service.ErrAlertRuleNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert rule not found")
+	case errors.Is(err, service.ErrInvalidRunbook):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrRunbookGuardrail):
+		respondWithError(w, http.StatusTooManyRequests, "GUARDRAIL", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
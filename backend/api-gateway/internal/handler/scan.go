@@ -4,10 +4,13 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
 	"github.com/wangjialin/myops/pkg/model"
 	"github.com/wangjialin/myops/pkg/ssh"
 	"gorm.io/gorm"
@@ -18,6 +21,7 @@ type ScanHandler struct {
 	db      *gorm.DB
 	scanner *ssh.Scanner
 	taskRepo interface{} // Will be ScanTaskRepository
+	operations *service.OperationService
 }
 
 // NewScanHandler creates a new ScanHandler
@@ -28,6 +32,11 @@ func NewScanHandler(db *gorm.DB) *ScanHandler {
 	}
 }
 
+// SetOperations sets the service scans run as operations of
+func (h *ScanHandler) SetOperations(operations *service.OperationService) {
+	h.operations = operations
+}
+
 // ScanRequest represents a scan request
 type ScanRequest struct {
 	IPRange        string `json:"ipRange"`
@@ -35,12 +44,13 @@ type ScanRequest struct {
 	TimeoutSeconds int    `json:"timeoutSeconds"`
 }
 
-// ScanResponse represents the initial scan response
+// ScanResponse is the result of a scan operation
 type ScanResponse struct {
 	TaskID         string `json:"taskId"`
 	Status         string `json:"status"`
 	IPRange        string `json:"ipRange"`
 	EstimatedHosts  int    `json:"estimatedHosts"`
+	DiscoveredHosts int    `json:"discoveredHosts,omitempty"`
 }
 
 // ServeHTTP handles HTTP requests for scanning
@@ -82,6 +92,9 @@ func (h *ScanHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
 		return
 	}
+	if !requirePermission(w, h.db, userID, "hosts", "create", nil, "") {
+		return
+	}
 
 	// Calculate estimated hosts
 	estimatedHosts, err := ssh.GetEstimatedHostCount(req.IPRange)
@@ -109,26 +122,32 @@ func (h *ScanHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Start background scan
-	go h.runScan(taskID, req)
-
-	// Return immediate response
-	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"data": ScanResponse{
-			TaskID:        taskID.String(),
-			Status:        string(model.ScanTaskStatusRunning),
-			IPRange:       req.IPRange,
-			EstimatedHosts: estimatedHosts * len(req.Ports),
-		},
-		"requestId": generateRequestID(),
+	// Run the scan as an operation, polled until it is done
+	operation, err := h.operations.Start(userID, service.OperationSpec{
+		Type:         model.OperationHostScan,
+		ResourceType: "scan_task",
+		ResourceID:   &taskID,
+		Message:      fmt.Sprintf("Scanning %s", req.IPRange),
+		Cancellable:  true,
+		Timeout:      time.Duration(req.TimeoutSeconds)*time.Second + time.Minute,
+	}, func(ctx context.Context) (interface{}, error) {
+		return h.runScan(ctx, task, req)
 	})
+	if err != nil {
+		h.db.Model(task).Updates(map[string]interface{}{
+			"status":        model.ScanTaskStatusFailed,
+			"error_message": err.Error(),
+			"completed_at":  time.Now(),
+		})
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to start scan")
+		return
+	}
+	respondAccepted(w, operation)
 }
 
-// runScan runs the scan in the background
-func (h *ScanHandler) runScan(taskID uuid.UUID, req ScanRequest) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.TimeoutSeconds)*time.Second+time.Minute)
-	defer cancel()
+// runScan runs the scan of an operation, returning what it found
+func (h *ScanHandler) runScan(ctx context.Context, task *model.ScanTask, req ScanRequest) (*ScanResponse, error) {
+	taskID := task.ID
 
 	resultChan := make(chan *ssh.DiscoveredHost)
 
@@ -141,15 +160,12 @@ func (h *ScanHandler) runScan(taskID uuid.UUID, req ScanRequest) {
 
 	// Run scan
 	if err := h.scanner.ScanRange(ctx, config, resultChan); err != nil {
-		h.db.Model(&model.ScanTask{}).Where("id = ?", taskID).Updates(map[string]interface{}{
-			"status":        model.ScanTaskStatusFailed,
-			"error_message": err.Error(),
-			"completed_at":   time.Now(),
-		})
-		return
+		h.finishScan(taskID, err)
+		return nil, err
 	}
 
 	// Process results
+	discoveredHosts := 0
 	for host := range resultChan {
 		if host.Status == "success" || host.Status == "open" {
 			// Save discovered host
@@ -167,14 +183,39 @@ func (h *ScanHandler) runScan(taskID uuid.UUID, req ScanRequest) {
 			h.db.Create(discovered)
 			h.db.Model(&model.ScanTask{}).Where("id = ?", taskID).
 				UpdateColumn("discovered_hosts", gorm.Expr("discovered_hosts + 1"))
+			discoveredHosts++
+			service.ReportProgress(ctx, 0, fmt.Sprintf("Scanning %s: %d hosts found", req.IPRange, discoveredHosts))
 		}
 	}
 
-	// Mark as completed
-	h.db.Model(&model.ScanTask{}).Where("id = ?", taskID).Updates(map[string]interface{}{
+	// A cancelled or timed out scan keeps the hosts found so far
+	if err := ctx.Err(); err != nil {
+		h.finishScan(taskID, err)
+		return nil, err
+	}
+	h.finishScan(taskID, nil)
+	return &ScanResponse{
+		TaskID:          taskID.String(),
+		Status:          string(model.ScanTaskStatusCompleted),
+		IPRange:         req.IPRange,
+		EstimatedHosts:  task.EstimatedHosts,
+		DiscoveredHosts: discoveredHosts,
+	}, nil
+}
+
+// finishScan records how a scan task ended
+func (h *ScanHandler) finishScan(taskID uuid.UUID, err error) {
+	updates := map[string]interface{}{
 		"status":       model.ScanTaskStatusCompleted,
 		"completed_at": time.Now(),
-	})
+	}
+	if errors.Is(err, context.Canceled) {
+		updates["status"] = model.ScanTaskStatusCancelled
+	} else if err != nil {
+		updates["status"] = model.ScanTaskStatusFailed
+		updates["error_message"] = err.Error()
+	}
+	h.db.Model(&model.ScanTask{}).Where("id = ?", taskID).Updates(updates)
 }
 
 // GetScanStatus handles scan task status queries
@@ -224,6 +265,6 @@ func (h *ScanHandler) GetScanStatus(w http.ResponseWriter, r *http.Request) {
 			"hosts":          hosts,
 			"ipRange":        task.IPRange,
 		},
-		"requestId": generateRequestID(),
+		"requestId": responseRequestID(w),
 	})
 }
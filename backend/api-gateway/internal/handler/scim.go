@@ -0,0 +1,209 @@
+// Package handler provides the SCIM 2.0 provisioning API
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// ScimHandler serves /scim/v2 for identity providers that push users and groups.
+// Clients authenticate with the scim.token bearer token rather than a user token.
+type ScimHandler struct {
+	scim *service.ScimService
+}
+
+// NewScimHandler creates a new SCIM handler
+func NewScimHandler(scim *service.ScimService) *ScimHandler {
+	return &ScimHandler{scim: scim}
+}
+
+// ServeHTTP routes SCIM requests
+func (h *ScimHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !h.scim.Authorize(token) {
+		respondWithScimError(w, http.StatusUnauthorized, "", "SCIM is disabled or the token is invalid")
+		return
+	}
+
+	// /scim/v2/{resource}[/{id}]
+	parts := splitPath(r.URL.Path)
+	if len(parts) < 3 || len(parts) > 4 {
+		respondWithScimError(w, http.StatusNotFound, "", "Unknown SCIM endpoint")
+		return
+	}
+	id := ""
+	if len(parts) == 4 {
+		id = parts[3]
+	}
+
+	switch parts[2] {
+	case "Users":
+		h.serveUsers(w, r, id)
+	case "Groups":
+		h.serveGroups(w, r, id)
+	case "ServiceProviderConfig":
+		h.serviceProviderConfig(w, r)
+	default:
+		respondWithScimError(w, http.StatusNotFound, "", "Unknown SCIM endpoint")
+	}
+}
+
+func (h *ScimHandler) serveUsers(w http.ResponseWriter, r *http.Request, id string) {
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		startIndex, count := scimPaging(r)
+		list, err := h.scim.ListUsers(r.URL.Query().Get("filter"), startIndex, count)
+		respondWithScim(w, http.StatusOK, list, err)
+	case id == "" && r.Method == http.MethodPost:
+		var req model.ScimUser
+		if !decodeScimBody(w, r, &req) {
+			return
+		}
+		user, err := h.scim.CreateUser(&req)
+		respondWithScim(w, http.StatusCreated, user, err)
+	case id != "" && r.Method == http.MethodGet:
+		user, err := h.scim.GetUser(id)
+		respondWithScim(w, http.StatusOK, user, err)
+	case id != "" && r.Method == http.MethodPut:
+		var req model.ScimUser
+		if !decodeScimBody(w, r, &req) {
+			return
+		}
+		user, err := h.scim.ReplaceUser(id, &req)
+		respondWithScim(w, http.StatusOK, user, err)
+	case id != "" && r.Method == http.MethodPatch:
+		var req model.ScimPatchRequest
+		if !decodeScimBody(w, r, &req) {
+			return
+		}
+		user, err := h.scim.PatchUser(id, &req)
+		respondWithScim(w, http.StatusOK, user, err)
+	case id != "" && r.Method == http.MethodDelete:
+		if err := h.scim.DeleteUser(id); err != nil {
+			respondWithScim(w, 0, nil, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondWithScimError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+	}
+}
+
+func (h *ScimHandler) serveGroups(w http.ResponseWriter, r *http.Request, id string) {
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		startIndex, count := scimPaging(r)
+		list, err := h.scim.ListGroups(r.URL.Query().Get("filter"), startIndex, count)
+		respondWithScim(w, http.StatusOK, list, err)
+	case id == "" && r.Method == http.MethodPost:
+		var req model.ScimGroup
+		if !decodeScimBody(w, r, &req) {
+			return
+		}
+		group, err := h.scim.CreateGroup(&req)
+		respondWithScim(w, http.StatusCreated, group, err)
+	case id != "" && r.Method == http.MethodGet:
+		group, err := h.scim.GetGroup(id)
+		respondWithScim(w, http.StatusOK, group, err)
+	case id != "" && r.Method == http.MethodPut:
+		var req model.ScimGroup
+		if !decodeScimBody(w, r, &req) {
+			return
+		}
+		group, err := h.scim.ReplaceGroup(id, &req)
+		respondWithScim(w, http.StatusOK, group, err)
+	case id != "" && r.Method == http.MethodPatch:
+		var req model.ScimPatchRequest
+		if !decodeScimBody(w, r, &req) {
+			return
+		}
+		group, err := h.scim.PatchGroup(id, &req)
+		respondWithScim(w, http.StatusOK, group, err)
+	case id != "" && r.Method == http.MethodDelete:
+		if err := h.scim.DeleteGroup(id); err != nil {
+			respondWithScim(w, 0, nil, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondWithScimError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+	}
+}
+
+// serviceProviderConfig tells clients which SCIM features are supported
+func (h *ScimHandler) serviceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithScimError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
+		return
+	}
+	supported := func(b bool) map[string]interface{} {
+		return map[string]interface{}{"supported": b}
+	}
+	respondWithScim(w, http.StatusOK, map[string]interface{}{
+		"schemas":        []string{model.ScimSchemaSPConfig},
+		"patch":          supported(true),
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": 500},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "The token configured in the scim.token setting",
+		}},
+	}, nil)
+}
+
+// scimPaging reads the 1-based startIndex and count query parameters
+func scimPaging(r *http.Request) (int, int) {
+	startIndex, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+	count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+	return startIndex, count
+}
+
+func decodeScimBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		respondWithScimError(w, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return false
+	}
+	return true
+}
+
+// respondWithScim sends a SCIM resource, or the SCIM error for err. SCIM clients
+// expect bare resources rather than the API's data envelope.
+func respondWithScim(w http.ResponseWriter, status int, resource interface{}, err error) {
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrScimNotFound):
+			respondWithScimError(w, http.StatusNotFound, "", "Resource not found")
+		case errors.Is(err, service.ErrScimConflict):
+			respondWithScimError(w, http.StatusConflict, "uniqueness", err.Error())
+		case errors.Is(err, service.ErrScimInvalid):
+			respondWithScimError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		default:
+			respondWithScimError(w, http.StatusInternalServerError, "", "Internal server error")
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resource)
+}
+
+func respondWithScimError(w http.ResponseWriter, status int, scimType, detail string) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(model.ScimError{
+		Schemas:  []string{model.ScimSchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
@@ -0,0 +1,70 @@
+// Package handler provides HTTP handlers for the global inventory search
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// SearchHandler serves the search across hosts, clusters, workloads, dashboards,
+// alert rules and Helm releases
+type SearchHandler struct {
+	search *service.SearchService
+}
+
+// NewSearchHandler creates a new search handler
+func NewSearchHandler(search *service.SearchService) *SearchHandler {
+	return &SearchHandler{search: search}
+}
+
+// Search returns the resources the user may see matching ?q, a name or a
+// key=value label, narrowed by ?types (comma-separated) with at most ?limit of
+// each type (GET /api/v1/search)
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	req := &model.SearchRequest{Query: query.Get("q")}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "limit must be a positive number")
+			return
+		}
+		req.Limit = n
+	}
+	for _, value := range strings.Split(query.Get("types"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		t := model.SearchResultType(value)
+		if !isSearchResultType(t) {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "types must be host, cluster, pod, deployment, dashboard, alert_rule or helm_release")
+			return
+		}
+		req.Types = append(req.Types, t)
+	}
+
+	response, err := h.search.Search(r.Context(), userID, req)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to search")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func isSearchResultType(t model.SearchResultType) bool {
+	for _, known := range model.SearchResultTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+// Package handler provides audit logging for websocket sessions and file transfers
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// Interactive sessions recorded in the audit log
+const (
+	auditSessionPodLogs     = "pod_logs"
+	auditSessionPodTerminal = "pod_terminal"
+	auditSessionSSHTerminal = "ssh_terminal"
+)
+
+// sessionAudit records an interactive websocket session in the audit log: one
+// entry when it opens and one when it closes, with its duration and the bytes
+// sent each way, so reviews can reconstruct who was connected where and for
+// how long
+type sessionAudit struct {
+	db      *gorm.DB
+	conn    *wsConn
+	entry   model.AuditLog
+	details map[string]interface{}
+	started time.Time
+}
+
+// auditSessionOpen records the opening of a session of kind on a resource.
+// details describe the target, e.g. the pod and container, and are repeated
+// in the closing entry.
+func auditSessionOpen(db *gorm.DB, r *http.Request, conn *wsConn, userID uuid.UUID, kind string, resource model.ResourceType, resourceID string, details map[string]interface{}) *sessionAudit {
+	username, _ := r.Context().Value("username").(string)
+	a := &sessionAudit{
+		db:   db,
+		conn: conn,
+		entry: model.AuditLog{
+			UserID:     userID,
+			Username:   username,
+			Action:     kind,
+			Resource:   string(resource),
+			ResourceID: resourceID,
+			Method:     "WS",
+			// The query is left out as it may carry the access token
+			Path:      r.URL.Path,
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		},
+		details: details,
+		started: time.Now(),
+	}
+	a.record("_open", http.StatusOK, a.details)
+	return a
+}
+
+// close records the end of the session. failure is the error that ended it,
+// if any.
+func (a *sessionAudit) close(failure error) {
+	details := make(map[string]interface{}, len(a.details)+3)
+	for k, v := range a.details {
+		details[k] = v
+	}
+	details["durationMs"] = time.Since(a.started).Milliseconds()
+	details["bytesIn"] = a.conn.bytesIn.Load()
+	details["bytesOut"] = a.conn.bytesOut.Load()
+
+	status := http.StatusOK
+	if failure != nil {
+		status = http.StatusBadGateway
+		a.entry.ErrorMsg = failure.Error()
+	}
+	a.record("_close", status, details)
+}
+
+func (a *sessionAudit) record(suffix string, status int, details map[string]interface{}) {
+	entry := a.entry
+	entry.ID = uuid.New()
+	entry.Action += suffix
+	entry.StatusCode = status
+	value, _ := json.Marshal(details)
+	entry.NewValue = string(value)
+	a.db.Create(&entry)
+}
+
+// auditFileTransfer records a file upload, download or deletion on a host with
+// the file's SHA-256 checksum, when known
+func auditFileTransfer(db *gorm.DB, r *http.Request, userID uuid.UUID, action string, host *model.Host, details map[string]interface{}, status int, failure error) {
+	username, _ := r.Context().Value("username").(string)
+	details["hostId"] = host.ID
+	details["hostname"] = host.Hostname
+	details["ipAddress"] = host.IPAddress
+	value, _ := json.Marshal(details)
+
+	entry := &model.AuditLog{
+		ID:         uuid.New(),
+		UserID:     userID,
+		Username:   username,
+		Action:     action,
+		Resource:   string(model.ResourceHost),
+		ResourceID: host.ID.String(),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		IPAddress:  r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+		StatusCode: status,
+		NewValue:   string(value),
+	}
+	if failure != nil {
+		entry.ErrorMsg = failure.Error()
+	}
+	db.Create(entry)
+}
@@ -0,0 +1,121 @@
+// Package handler provides HTTP handlers for runtime settings
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// SettingsHandler handles runtime setting operations
+type SettingsHandler struct {
+	db       *gorm.DB
+	settings *service.SettingsService
+}
+
+// NewSettingsHandler creates a new settings handler
+func NewSettingsHandler(db *gorm.DB, settings *service.SettingsService) *SettingsHandler {
+	return &SettingsHandler{db: db, settings: settings}
+}
+
+// ListSettings lists every setting with its effective value, optionally filtered by
+// ?category
+func (h *SettingsHandler) ListSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "view", nil, "") {
+		return
+	}
+
+	settings := h.settings.List(r.URL.Query().Get("category"))
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  settings,
+		"total": len(settings),
+	})
+}
+
+// GetSetting gets one setting
+func (h *SettingsHandler) GetSetting(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "view", nil, "") {
+		return
+	}
+
+	setting, err := h.settings.Get(settingKey(r))
+	if err != nil {
+		respondWithSettingError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, setting)
+}
+
+// UpdateSetting overrides a setting. The change applies without a restart.
+func (h *SettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "manage", nil, "") {
+		return
+	}
+
+	var req model.UpdateSettingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	setting, err := h.settings.Set(settingKey(r), req.Value, userID)
+	if err != nil {
+		respondWithSettingError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, setting)
+}
+
+// ResetSetting removes a setting's override so its default applies again
+func (h *SettingsHandler) ResetSetting(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requirePermission(w, h.db, userID, "settings", "manage", nil, "") {
+		return
+	}
+
+	setting, err := h.settings.Reset(settingKey(r), userID)
+	if err != nil {
+		respondWithSettingError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, setting)
+}
+
+// settingKey returns the setting key in /api/v1/settings/{key}
+func settingKey(r *http.Request) string {
+	parts := splitPath(r.URL.Path)
+	if len(parts) < 4 {
+		return ""
+	}
+	return parts[3]
+}
+
+func respondWithSettingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUnknownSetting):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Setting not found")
+	case errors.Is(err, service.ErrInvalidSetting):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update setting")
+	}
+}
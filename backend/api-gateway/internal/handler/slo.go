@@ -0,0 +1,192 @@
+// Package handler provides HTTP handlers for service level objectives
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// SLOHandler handles the user's SLOs, their error budgets and burn-rate alerts
+type SLOHandler struct {
+	slos *service.SLOService
+}
+
+// NewSLOHandler creates a new SLO handler
+func NewSLOHandler(slos *service.SLOService) *SLOHandler {
+	return &SLOHandler{slos: slos}
+}
+
+// ListSLOs lists the user's SLOs with their last evaluation (GET /api/v1/slos)
+func (h *SLOHandler) ListSLOs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	slos, err := h.slos.List(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch SLOs")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  slos,
+		"total": len(slos),
+	})
+}
+
+// CreateSLO defines an SLO; burn-rate alerts default to the multi-window
+// tiers when omitted (POST /api/v1/slos)
+func (h *SLOHandler) CreateSLO(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateSLORequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	slo, err := h.slos.Create(userID, &req)
+	if err != nil {
+		respondWithSLOError(w, err, "Failed to create SLO")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, slo)
+}
+
+// GetSLO gets an SLO (GET /api/v1/slos/{id})
+func (h *SLOHandler) GetSLO(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "SLO")
+	if !ok {
+		return
+	}
+
+	slo, err := h.slos.Get(userID, id)
+	if err != nil {
+		respondWithSLOError(w, err, "Failed to fetch SLO")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, slo)
+}
+
+// UpdateSLO changes an SLO (PUT /api/v1/slos/{id})
+func (h *SLOHandler) UpdateSLO(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "SLO")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateSLORequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	slo, err := h.slos.Update(userID, id, &req)
+	if err != nil {
+		respondWithSLOError(w, err, "Failed to update SLO")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, slo)
+}
+
+// DeleteSLO removes an SLO with its burn-rate alert rules (DELETE /api/v1/slos/{id})
+func (h *SLOHandler) DeleteSLO(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "SLO")
+	if !ok {
+		return
+	}
+
+	if err := h.slos.Delete(userID, id); err != nil {
+		respondWithSLOError(w, err, "Failed to delete SLO")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "SLO deleted successfully",
+	})
+}
+
+// EvaluateSLO evaluates an SLO now (POST /api/v1/slos/{id}/evaluate)
+func (h *SLOHandler) EvaluateSLO(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "SLO")
+	if !ok {
+		return
+	}
+
+	slo, err := h.slos.Evaluate(r.Context(), userID, id)
+	if err != nil {
+		respondWithSLOError(w, err, "Failed to evaluate SLO")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, slo)
+}
+
+// GetSLOHistory returns the error budget burn-down between the optional start
+// and end, by default over the last SLO window (GET /api/v1/slos/{id}/history)
+func (h *SLOHandler) GetSLOHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "SLO")
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	start, err := parseQueryTime(params.Get("start"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid start time")
+		return
+	}
+	end, err := parseQueryTime(params.Get("end"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid end time")
+		return
+	}
+
+	history, err := h.slos.History(r.Context(), userID, id, start, end)
+	if err != nil {
+		respondWithSLOError(w, err, "Failed to fetch SLO history")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, history)
+}
+
+// respondWithSLOError maps SLO service errors to responses
+func respondWithSLOError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidSLO):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrSLONotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "SLO not found")
+	case errors.Is(err, service.ErrPrometheusDataSourceNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Data source not found")
+	case errors.Is(err, service.ErrPrometheusQueryFailed):
+		respondWithError(w, http.StatusBadGateway, "QUERY_FAILED", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
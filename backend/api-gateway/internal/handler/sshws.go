@@ -20,29 +20,15 @@ import (
 
 // SSHWebSocketHandler handles SSH WebSocket connections
 type SSHWebSocketHandler struct {
-	db           *gorm.DB
-	proxy         *ssh.SSHProxy
-	upgrader      websocket.Upgrader
-	pingInterval  time.Duration
-	pingWait      time.Duration
-	writeWait     time.Duration
+	db    *gorm.DB
+	proxy *ssh.SSHProxy
 }
 
 // NewSSHWebSocketHandler creates a new SSH WebSocket handler
 func NewSSHWebSocketHandler(db *gorm.DB, logger io.Writer) *SSHWebSocketHandler {
 	return &SSHWebSocketHandler{
-		db:      db,
-		proxy:   ssh.NewSSHProxy(logger),
-		upgrader: websocket.Upgrader{
-			ReadBufferSize:   8192,
-			WriteBufferSize: 8192,
-			CheckOrigin: func(r *http.Request) bool {
-				return true // TODO: Configure proper origin checking
-			},
-		},
-		pingInterval: 30 * time.Second,
-		pingWait:     10 * time.Second,
-		writeWait:    10 * time.Second,
+		db:    db,
+		proxy: ssh.NewSSHProxy(logger),
 	}
 }
 
@@ -80,16 +66,8 @@ func (h *SSHWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get user ID from context
-	var userID uuid.UUID
-	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
-		if uid, ok := userIDVal.(string); ok {
-			userID, _ = uuid.Parse(uid)
-		}
-	}
-
-	if userID == (uuid.UUID{}) {
-		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+	r, userID, ok := authenticateWebSocket(w, r)
+	if !ok {
 		return
 	}
 
@@ -111,7 +89,7 @@ func (h *SSHWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Upgrade to WebSocket
-	conn, err := h.upgrader.Upgrade(w, r, nil)
+	conn, err := upgradeWebSocket(w, r, userID)
 	if err != nil {
 		h.log("WebSocket upgrade failed: %v", err)
 		return
@@ -166,8 +144,20 @@ func (h *SSHWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	sessionCtx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Attempts that fail to connect are recorded as well
+	audit := auditSessionOpen(h.db, r, conn, userID, auditSessionSSHTerminal, model.ResourceHost, host.ID.String(), map[string]interface{}{
+		"hostId":    host.ID,
+		"hostname":  host.Hostname,
+		"ipAddress": host.IPAddress,
+		"sshUser":   connectReq.Username,
+		"sessionId": sessionID,
+	})
+	var sessionErr error
+	defer func() { audit.close(sessionErr) }()
+
 	session, err := h.proxy.Connect(sessionCtx, connectConfig)
 	if err != nil {
+		sessionErr = err
 		h.writeWSError(conn, "SSH connection failed", err)
 		return
 	}
@@ -181,13 +171,14 @@ func (h *SSHWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 
 	// Start SSH session (shell)
 	if err := session.SSHSession.Shell(); err != nil {
+		sessionErr = err
 		h.writeWSError(conn, "Failed to start shell", err)
 		return
 	}
 
 	// Start goroutines for bidirectional communication
 	var wg sync.WaitGroup
-	wg.Add(3)
+	wg.Add(2)
 
 	// Read from SSH and write to WebSocket
 	done := make(chan struct{})
@@ -266,25 +257,6 @@ func (h *SSHWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		}
 	}()
 
-	// Ping handler
-	go func() {
-		defer wg.Done()
-		ticker := time.NewTicker(h.pingInterval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-done:
-				return
-			case <-ticker.C:
-				if err := conn.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
-					h.log("WebSocket ping failed: session=%s", session.ID)
-					return
-				}
-			}
-		}
-	}()
-
 	// Wait for disconnect
 	<-session.Ctx.Done()
 	close(done)
@@ -299,7 +271,7 @@ func (h *SSHWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 }
 
 // readWSMessage reads a message from WebSocket with timeout
-func (h *SSHWebSocketHandler) readWSMessage(conn *websocket.Conn, timeout time.Duration) (string, error) {
+func (h *SSHWebSocketHandler) readWSMessage(conn *wsConn, timeout time.Duration) (string, error) {
 	conn.SetReadDeadline(time.Now().Add(timeout))
 	_, data, err := conn.ReadMessage()
 	if err != nil {
@@ -312,19 +284,19 @@ func (h *SSHWebSocketHandler) readWSMessage(conn *websocket.Conn, timeout time.D
 }
 
 // writeWSMessage writes a message to WebSocket
-func (h *SSHWebSocketHandler) writeWSMessage(conn *websocket.Conn, msg interface{}) error {
-	conn.SetWriteDeadline(time.Now().Add(h.writeWait))
+func (h *SSHWebSocketHandler) writeWSMessage(conn *wsConn, msg interface{}) error {
 	return conn.WriteJSON(msg)
 }
 
 // writeWSError writes an error message to WebSocket and closes the connection
-func (h *SSHWebSocketHandler) writeWSError(conn *websocket.Conn, message string, err error) {
+// with 1011 (internal error)
+func (h *SSHWebSocketHandler) writeWSError(conn *wsConn, message string, err error) {
 	h.writeWSMessage(conn, map[string]interface{}{
 		"type":    "error",
 		"message": message,
 		"error":   err.Error(),
 	})
-	conn.Close()
+	conn.CloseWith(websocket.CloseInternalServerErr, message)
 }
 
 // log writes a log message
@@ -0,0 +1,259 @@
+// Package handler provides HTTP handlers for synthetic checks
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// defaultUptimePeriod is the uptime period when no start is given
+const defaultUptimePeriod = 24 * time.Hour
+
+// SyntheticHandler handles the user's synthetic checks, their results and uptime
+type SyntheticHandler struct {
+	synthetics *service.SyntheticService
+}
+
+// NewSyntheticHandler creates a new synthetic check handler
+func NewSyntheticHandler(synthetics *service.SyntheticService) *SyntheticHandler {
+	return &SyntheticHandler{synthetics: synthetics}
+}
+
+// ListChecks lists the user's checks with their last run (GET /api/v1/synthetics)
+func (h *SyntheticHandler) ListChecks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	checks, err := h.synthetics.List(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch synthetic checks")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  checks,
+		"total": len(checks),
+	})
+}
+
+// CreateCheck adds a check, by default probed from the gateway every minute
+// (POST /api/v1/synthetics)
+func (h *SyntheticHandler) CreateCheck(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateSyntheticCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	check, err := h.synthetics.Create(userID, &req)
+	if err != nil {
+		respondWithSyntheticError(w, err, "Failed to create synthetic check")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, check)
+}
+
+// GetCheck gets a check (GET /api/v1/synthetics/{id})
+func (h *SyntheticHandler) GetCheck(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "synthetic check")
+	if !ok {
+		return
+	}
+
+	check, err := h.synthetics.Get(userID, id)
+	if err != nil {
+		respondWithSyntheticError(w, err, "Failed to fetch synthetic check")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, check)
+}
+
+// UpdateCheck changes a check (PUT /api/v1/synthetics/{id})
+func (h *SyntheticHandler) UpdateCheck(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "synthetic check")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateSyntheticCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	check, err := h.synthetics.Update(userID, id, &req)
+	if err != nil {
+		respondWithSyntheticError(w, err, "Failed to update synthetic check")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, check)
+}
+
+// DeleteCheck removes a check with its results and alert rule
+// (DELETE /api/v1/synthetics/{id})
+func (h *SyntheticHandler) DeleteCheck(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "synthetic check")
+	if !ok {
+		return
+	}
+
+	if err := h.synthetics.Delete(userID, id); err != nil {
+		respondWithSyntheticError(w, err, "Failed to delete synthetic check")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Synthetic check deleted successfully",
+	})
+}
+
+// RunCheck runs a check from all its locations now and returns the results
+// (POST /api/v1/synthetics/{id}/run)
+func (h *SyntheticHandler) RunCheck(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "synthetic check")
+	if !ok {
+		return
+	}
+
+	results, err := h.synthetics.RunNow(r.Context(), userID, id)
+	if err != nil {
+		respondWithSyntheticError(w, err, "Failed to run synthetic check")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  results,
+		"total": len(results),
+	})
+}
+
+// ListResults lists a check's results, newest first, optionally by location,
+// success and time (GET /api/v1/synthetics/{id}/results)
+func (h *SyntheticHandler) ListResults(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "synthetic check")
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	page, pageSize := pageParams(r)
+	filter := &model.SyntheticResultFilter{
+		Location: params.Get("location"),
+		Limit:    pageSize,
+		Offset:   (page - 1) * pageSize,
+	}
+	if v := params.Get("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid success filter")
+			return
+		}
+		filter.Success = &success
+	}
+	var err error
+	if filter.Since, err = parseQueryTime(params.Get("start")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid start time")
+		return
+	}
+	if filter.Until, err = parseQueryTime(params.Get("end")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid end time")
+		return
+	}
+
+	results, total, err := h.synthetics.Results(userID, id, filter)
+	if err != nil {
+		respondWithSyntheticError(w, err, "Failed to fetch synthetic results")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":     results,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// GetUptime returns a check's uptime overall and per location between the
+// optional start and end, by default over the last day
+// (GET /api/v1/synthetics/{id}/uptime)
+func (h *SyntheticHandler) GetUptime(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 3, "synthetic check")
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	start, err := parseQueryTime(params.Get("start"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid start time")
+		return
+	}
+	end, err := parseQueryTime(params.Get("end"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid end time")
+		return
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if start.IsZero() {
+		start = end.Add(-defaultUptimePeriod)
+	}
+	if !start.Before(end) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Start must be before end")
+		return
+	}
+
+	uptime, err := h.synthetics.Uptime(userID, id, start, end)
+	if err != nil {
+		respondWithSyntheticError(w, err, "Failed to fetch synthetic uptime")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, uptime)
+}
+
+// respondWithSyntheticError maps synthetic check service errors to responses
+func respondWithSyntheticError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidSyntheticCheck):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrSyntheticCheckNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Synthetic check not found")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
@@ -0,0 +1,137 @@
+// Package handler provides HTTP handlers for tags on platform resources
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// maxTagLookupIDs bounds the resources one tag lookup can name
+const maxTagLookupIDs = 500
+
+// TagHandler handles the tags of clusters, data sources, dashboards, alert rules
+// and Helm releases
+type TagHandler struct {
+	tags *service.TagService
+}
+
+// NewTagHandler creates a new tag handler
+func NewTagHandler(tags *service.TagService) *TagHandler {
+	return &TagHandler{tags: tags}
+}
+
+// GetTags returns the tags of the resources of ?resourceType named by ?ids
+// (comma-separated), by resource ID (GET /api/v1/tags)
+func (h *TagHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	var ids []uuid.UUID
+	for _, value := range strings.Split(query.Get("ids"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_ID", "Invalid resource ID "+value)
+			return
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 || len(ids) > maxTagLookupIDs {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", fmt.Sprintf("ids must name between 1 and %d resources", maxTagLookupIDs))
+		return
+	}
+
+	tags, err := h.tags.Get(r.Context(), userID, model.TagResourceType(query.Get("resourceType")), ids)
+	if err != nil {
+		respondWithTagError(w, err, "Failed to retrieve tags")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"tags": tags})
+}
+
+// SetTags replaces every tag of a resource (PUT /api/v1/tags/{resourceType}/{id})
+func (h *TagHandler) SetTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "resource")
+	if !ok {
+		return
+	}
+	resourceType := model.TagResourceType(splitPath(r.URL.Path)[3])
+
+	var req model.SetTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	tags, err := h.tags.Set(r.Context(), userID, resourceType, id, req.Tags)
+	if err != nil {
+		respondWithTagError(w, err, "Failed to update tags")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"tags": tags})
+}
+
+// BulkTags adds and removes tags on many resources at once (POST /api/v1/tags/bulk)
+func (h *TagHandler) BulkTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.BulkTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	result, err := h.tags.Bulk(r.Context(), userID, &req)
+	if err != nil {
+		respondWithTagError(w, err, "Failed to update tags")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// ListTagKeys returns the tag keys and values in use on the user's resources,
+// optionally of ?resourceType only (GET /api/v1/tags/keys)
+func (h *TagHandler) ListTagKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := h.tags.Keys(r.Context(), userID, model.TagResourceType(r.URL.Query().Get("resourceType")))
+	if err != nil {
+		respondWithTagError(w, err, "Failed to retrieve tag keys")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// respondWithTagError sends the status of a tag service error
+func respondWithTagError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTags):
+		respondWithError(w, http.StatusBadRequest, "INVALID_TAGS", err.Error())
+	case errors.Is(err, service.ErrTaggedResourceNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Resource not found")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
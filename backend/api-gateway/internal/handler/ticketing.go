@@ -0,0 +1,277 @@
+// Package handler provides HTTP handlers for ticketing system integrations
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// maxTicketWebhookBytes bounds the body of inbound ticketing webhooks
+const maxTicketWebhookBytes = 1 << 20
+
+// TicketingHandler handles ticketing integrations, the issues alerts open and
+// the webhooks ticketing systems call back
+type TicketingHandler struct {
+	ticketing *service.TicketingService
+}
+
+// NewTicketingHandler creates a new ticketing handler
+func NewTicketingHandler(ticketing *service.TicketingService) *TicketingHandler {
+	return &TicketingHandler{ticketing: ticketing}
+}
+
+// ============== Integrations ==============
+
+// CreateIntegration creates a ticketing integration. The token of its inbound
+// webhook is only returned here.
+func (h *TicketingHandler) CreateIntegration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateTicketIntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	integration, token, err := h.ticketing.Create(userID, &req)
+	if err != nil {
+		respondWithTicketingError(w, err, "Failed to create ticketing integration")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"integration":  integration.Response(),
+		"inboundToken": token,
+	})
+}
+
+// ListIntegrations lists the user's ticketing integrations
+func (h *TicketingHandler) ListIntegrations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	integrations, err := h.ticketing.List(userID)
+	if err != nil {
+		respondWithTicketingError(w, err, "Failed to fetch ticketing integrations")
+		return
+	}
+	responses := make([]model.TicketIntegrationResponse, 0, len(integrations))
+	for i := range integrations {
+		responses = append(responses, integrations[i].Response())
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  responses,
+		"total": len(responses),
+	})
+}
+
+// GetIntegration gets a ticketing integration
+func (h *TicketingHandler) GetIntegration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "integration")
+	if !ok {
+		return
+	}
+
+	integration, err := h.ticketing.Get(userID, id)
+	if err != nil {
+		respondWithTicketingError(w, err, "Failed to fetch ticketing integration")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, integration.Response())
+}
+
+// UpdateIntegration updates a ticketing integration
+func (h *TicketingHandler) UpdateIntegration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "integration")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateTicketIntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	integration, err := h.ticketing.Update(userID, id, &req)
+	if err != nil {
+		respondWithTicketingError(w, err, "Failed to update ticketing integration")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, integration.Response())
+}
+
+// DeleteIntegration deletes a ticketing integration and its links to alerts
+func (h *TicketingHandler) DeleteIntegration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "integration")
+	if !ok {
+		return
+	}
+
+	if err := h.ticketing.Delete(userID, id); err != nil {
+		respondWithTicketingError(w, err, "Failed to delete ticketing integration")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Ticketing integration deleted successfully",
+	})
+}
+
+// TestIntegration checks an integration's credentials against its ticketing system
+func (h *TicketingHandler) TestIntegration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "integration")
+	if !ok {
+		return
+	}
+
+	if err := h.ticketing.Test(r.Context(), userID, id); err != nil {
+		respondWithTicketingError(w, err, "Failed to test ticketing integration")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Connected to the ticketing system successfully",
+	})
+}
+
+// RotateInboundToken replaces the token of an integration's inbound webhook
+func (h *TicketingHandler) RotateInboundToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, 4, "integration")
+	if !ok {
+		return
+	}
+
+	token, err := h.ticketing.RotateInboundToken(userID, id)
+	if err != nil {
+		respondWithTicketingError(w, err, "Failed to rotate inbound token")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"inboundToken": token,
+	})
+}
+
+// ============== Alert tickets ==============
+
+// ListAlertTickets lists the issues opened for an alert (GET /api/v1/alerts/{id}/tickets)
+func (h *TicketingHandler) ListAlertTickets(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	alertID, ok := pathUUID(w, r, 3, "alert")
+	if !ok {
+		return
+	}
+
+	tickets, err := h.ticketing.Tickets(userID, alertID)
+	if err != nil {
+		respondWithTicketingError(w, err, "Failed to fetch alert tickets")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  tickets,
+		"total": len(tickets),
+	})
+}
+
+// OpenAlertTicket queues opening an issue for an alert in an integration
+// (POST /api/v1/alerts/{id}/tickets)
+func (h *TicketingHandler) OpenAlertTicket(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	alertID, ok := pathUUID(w, r, 3, "alert")
+	if !ok {
+		return
+	}
+
+	var req model.OpenAlertTicketRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	if err := h.ticketing.OpenTicket(userID, alertID, req.IntegrationID); err != nil {
+		respondWithTicketingError(w, err, "Failed to open ticket")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"message": "Ticket queued",
+	})
+}
+
+// ============== Inbound webhooks ==============
+
+// Inbound receives issue events from the ticketing system of an integration
+// (POST /api/v1/ticketing/inbound/{id}). It is public; the caller presents the
+// integration's inbound token as a bearer token, never in the query, which is logged.
+func (h *TicketingHandler) Inbound(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathUUID(w, r, 4, "integration")
+	if !ok {
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxTicketWebhookBytes))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	if err := h.ticketing.HandleInbound(r.Context(), id, token, body); err != nil {
+		respondWithTicketingError(w, err, "Failed to sync ticket")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"message": "Ticket synced",
+	})
+}
+
+// respondWithTicketingError maps ticketing service errors to responses
+func respondWithTicketingError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTicketIntegration):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrTicketIntegrationNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Ticketing integration not found")
+	case errors.Is(err, service.ErrTicketAlertNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Alert not found")
+	case errors.Is(err, service.ErrTicketUnauthorized):
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid inbound token")
+	case errors.Is(err, service.ErrTicketingFailed):
+		respondWithError(w, http.StatusBadGateway, "TICKETING_ERROR", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
@@ -0,0 +1,75 @@
+// Package handler provides HTTP handlers for the topology map
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// TopologyHandler serves the map of clusters and managed hosts
+type TopologyHandler struct {
+	db       *gorm.DB
+	topology *service.TopologyService
+}
+
+// NewTopologyHandler creates a new topology handler
+func NewTopologyHandler(db *gorm.DB, topology *service.TopologyService) *TopologyHandler {
+	return &TopologyHandler{db: db, topology: topology}
+}
+
+// GetTopology returns the map as the user may see it, narrowed by ?clusterIds
+// and ?kinds (comma-separated), ?namespace and ?health, which keeps nodes at
+// least that unhealthy; ?hosts=false leaves out managed hosts. Changes arrive as
+// topology.changed events on the event stream.
+func (h *TopologyHandler) GetTopology(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := model.TopologyFilter{
+		Namespace: query.Get("namespace"),
+		MinHealth: model.TopologyHealth(query.Get("health")),
+		Hosts:     query.Get("hosts") != "false",
+	}
+	for _, value := range strings.Split(query.Get("clusterIds"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_CLUSTER_ID", "Invalid cluster ID")
+			return
+		}
+		filter.ClusterIDs = append(filter.ClusterIDs, id)
+	}
+	for _, value := range strings.Split(query.Get("kinds"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		switch k := model.TopologyKind(value); k {
+		case model.TopologyKindCluster, model.TopologyKindNode, model.TopologyKindPod, model.TopologyKindService, model.TopologyKindHost:
+			filter.Kinds = append(filter.Kinds, k)
+		default:
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "kinds must be cluster, node, pod, service or host")
+			return
+		}
+	}
+	if filter.MinHealth != "" && filter.MinHealth.Rank() == 0 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "health must be healthy, warning or critical")
+		return
+	}
+
+	graph, err := h.topology.Graph(r.Context(), userID, &filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to build topology")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, graph)
+}
@@ -0,0 +1,477 @@
+// Package handler provides HTTP handlers for distributed tracing backends
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// traceQueryTimeout bounds requests made to tracing backends
+const traceQueryTimeout = 30 * time.Second
+
+// TraceHandler handles trace data source and trace query operations
+type TraceHandler struct {
+	db     *gorm.DB
+	traces *service.TraceService
+}
+
+// NewTraceHandler creates a new trace handler
+func NewTraceHandler(db *gorm.DB) *TraceHandler {
+	return &TraceHandler{db: db, traces: service.NewTraceService(db)}
+}
+
+// ============== Data Source Management ==============
+
+// CreateDataSource creates a new Tempo or Jaeger data source
+func (h *TraceHandler) CreateDataSource(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateTraceDataSourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if req.Name == "" || req.URL == "" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "name and url are required")
+		return
+	}
+	if !req.Type.IsValid() {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "type must be tempo or jaeger")
+		return
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "url must be an http or https URL")
+		return
+	}
+
+	// Verify cluster ownership if provided
+	if req.ClusterID != nil {
+		var cluster model.K8sCluster
+		if err := h.db.Where("id = ? AND user_id = ?", req.ClusterID, userID).First(&cluster).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+			} else {
+				respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch cluster")
+			}
+			return
+		}
+	}
+
+	var existing model.TraceDataSource
+	if err := h.db.Where("user_id = ? AND name = ?", userID, req.Name).First(&existing).Error; err == nil {
+		respondWithError(w, http.StatusConflict, "CONFLICT", "Data source name already exists")
+		return
+	}
+	if !enforceQuota(w, userID, model.QuotaResourceDataSources, 1) {
+		return
+	}
+
+	dataSource := model.TraceDataSource{
+		UserID:          userID,
+		ClusterID:       req.ClusterID,
+		Name:            req.Name,
+		Type:            req.Type,
+		URL:             req.URL,
+		Username:        req.Username,
+		Password:        req.Password,
+		Token:           req.Token,
+		TenantID:        req.TenantID,
+		Status:          model.DSStatusActive,
+		InsecureSkipTLS: req.InsecureSkipTLS,
+		Headers:         req.Headers,
+	}
+	if err := h.db.Create(&dataSource).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create data source")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, dataSource)
+}
+
+// ListDataSources lists the user's trace data sources
+func (h *TraceHandler) ListDataSources(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	query := h.db.Model(&model.TraceDataSource{}).Where("user_id = ?", userID)
+	if clusterID, err := uuid.Parse(r.URL.Query().Get("clusterId")); err == nil {
+		query = query.Where("cluster_id = ?", clusterID)
+	}
+	if dsType := r.URL.Query().Get("type"); dsType != "" {
+		query = query.Where("type = ?", dsType)
+	}
+
+	var dataSources []model.TraceDataSource
+	if err := query.Preload("Cluster").Order("created_at DESC").Find(&dataSources).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch data sources")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  dataSources,
+		"total": len(dataSources),
+	})
+}
+
+// GetDataSource gets a trace data source
+func (h *TraceHandler) GetDataSource(w http.ResponseWriter, r *http.Request) {
+	dataSource, ok := h.ownedDataSource(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, dataSource)
+}
+
+// UpdateDataSource updates a trace data source
+func (h *TraceHandler) UpdateDataSource(w http.ResponseWriter, r *http.Request) {
+	dataSource, ok := h.ownedDataSource(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.UpdateTraceDataSourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.URL != nil {
+		updates["url"] = *req.URL
+	}
+	if req.Username != nil {
+		updates["username"] = *req.Username
+	}
+	if req.Password != nil {
+		updates["password"] = *req.Password
+	}
+	if req.Token != nil {
+		updates["token"] = *req.Token
+	}
+	if req.TenantID != nil {
+		updates["tenant_id"] = *req.TenantID
+	}
+	if req.InsecureSkipTLS != nil {
+		updates["insecure_skip_tls"] = *req.InsecureSkipTLS
+	}
+	if req.Headers != nil {
+		updates["headers"] = *req.Headers
+	}
+	if req.Status != nil {
+		updates["status"] = *req.Status
+	}
+
+	if err := h.db.Model(dataSource).Updates(updates).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update data source")
+		return
+	}
+
+	h.db.Preload("Cluster").First(dataSource, dataSource.ID)
+	respondWithJSON(w, http.StatusOK, dataSource)
+}
+
+// DeleteDataSource deletes a trace data source
+func (h *TraceHandler) DeleteDataSource(w http.ResponseWriter, r *http.Request) {
+	dataSource, ok := h.ownedDataSource(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(dataSource).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete data source")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Data source deleted successfully",
+	})
+}
+
+// TestDataSource checks that a trace data source is reachable
+func (h *TraceHandler) TestDataSource(w http.ResponseWriter, r *http.Request) {
+	dataSource, ok := h.ownedDataSource(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), traceQueryTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := h.traces.Test(ctx, dataSource)
+	response := map[string]interface{}{
+		"success":  err == nil,
+		"duration": time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// ============== Trace Queries ==============
+
+// SearchTraces searches traces.
+// Query parameters: service, operation, tag (key=value, repeatable), minDuration,
+// maxDuration, start, end (RFC 3339 or unix seconds), limit.
+func (h *TraceHandler) SearchTraces(w http.ResponseWriter, r *http.Request) {
+	dataSource, ok := h.ownedDataSource(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	query := model.TraceSearchQuery{
+		Service:   params.Get("service"),
+		Operation: params.Get("operation"),
+	}
+
+	for _, tag := range params["tag"] {
+		key, value, found := strings.Cut(tag, "=")
+		if !found || key == "" {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "tag must be key=value")
+			return
+		}
+		if query.Tags == nil {
+			query.Tags = map[string]string{}
+		}
+		query.Tags[key] = value
+	}
+
+	var err error
+	if query.MinDuration, err = parseOptionalDuration(params.Get("minDuration")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_DURATION", "Invalid minDuration")
+		return
+	}
+	if query.MaxDuration, err = parseOptionalDuration(params.Get("maxDuration")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_DURATION", "Invalid maxDuration")
+		return
+	}
+	if query.Start, err = parseQueryTime(params.Get("start")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid start time")
+		return
+	}
+	if query.End, err = parseQueryTime(params.Get("end")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid end time")
+		return
+	}
+	if limitStr := params.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > service.MaxTraceSearchLimit {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "limit must be between 1 and 100")
+			return
+		}
+		query.Limit = limit
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), traceQueryTimeout)
+	defer cancel()
+
+	traces, err := h.traces.Search(ctx, dataSource, query)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "TRACE_BACKEND_ERROR", err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  traces,
+		"total": len(traces),
+	})
+}
+
+// GetTrace fetches a trace by ID
+func (h *TraceHandler) GetTrace(w http.ResponseWriter, r *http.Request) {
+	dataSource, ok := h.ownedDataSource(w, r)
+	if !ok {
+		return
+	}
+
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) != 7 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), traceQueryTimeout)
+	defer cancel()
+
+	trace, err := h.traces.GetTrace(ctx, dataSource, pathParts[6])
+	if err != nil {
+		if errors.Is(err, service.ErrTraceNotFound) {
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Trace not found")
+		} else {
+			respondWithError(w, http.StatusBadGateway, "TRACE_BACKEND_ERROR", err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": trace,
+	})
+}
+
+// GetAnomalyTraces lists candidate traces within an anomaly's window for root-cause exploration.
+// Query parameters: dataSourceId (defaults to the user's data source for the anomaly's cluster),
+// service (defaults to the service in the anomaly's labels), limit (default 10).
+func (h *TraceHandler) GetAnomalyTraces(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) != 6 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+	anomalyID, err := uuid.Parse(pathParts[4])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid anomaly event ID format")
+		return
+	}
+
+	var event model.AnomalyEvent
+	if err := h.db.Where("id = ? AND user_id = ?", anomalyID, userID).First(&event).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Anomaly event not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch anomaly event")
+		}
+		return
+	}
+
+	params := r.URL.Query()
+	query := h.db.Where("user_id = ? AND status = ?", userID, model.DSStatusActive)
+	if dsID := params.Get("dataSourceId"); dsID != "" {
+		dataSourceID, err := uuid.Parse(dsID)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID format")
+			return
+		}
+		query = query.Where("id = ?", dataSourceID)
+	} else if event.ClusterID != nil {
+		// Prefer the data source linked to the anomaly's cluster
+		query = query.Order(gorm.Expr("COALESCE(cluster_id = ?, false) DESC", *event.ClusterID))
+	}
+
+	var dataSource model.TraceDataSource
+	if err := query.Order("created_at").First(&dataSource).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "No active trace data source")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch data source")
+		}
+		return
+	}
+
+	limit := 10
+	if limitStr := params.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 50 {
+			limit = l
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), traceQueryTimeout)
+	defer cancel()
+
+	candidates, err := h.traces.AnomalyCandidates(ctx, &dataSource, &event, params.Get("service"), limit)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "TRACE_BACKEND_ERROR", err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": candidates,
+	})
+}
+
+// ownedDataSource resolves the data source in the URL path and checks that the user owns it
+func (h *TraceHandler) ownedDataSource(w http.ResponseWriter, r *http.Request) (*model.TraceDataSource, bool) {
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) < 5 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return nil, false
+	}
+
+	dataSourceID, err := uuid.Parse(pathParts[4])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid data source ID format")
+		return nil, false
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	var dataSource model.TraceDataSource
+	if err := h.db.Preload("Cluster").Where("id = ? AND user_id = ?", dataSourceID, userID).First(&dataSource).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Data source not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch data source")
+		}
+		return nil, false
+	}
+
+	return &dataSource, true
+}
+
+// requestUserID returns the authenticated user's ID, sending a 401 response when there is none
+func requestUserID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	var userID uuid.UUID
+	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
+		if uid, ok := userIDVal.(string); ok {
+			userID, _ = uuid.Parse(uid)
+		}
+	}
+
+	if userID == (uuid.UUID{}) {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "User not authenticated")
+		return userID, false
+	}
+	return userID, true
+}
+
+// parseOptionalDuration parses a Go duration, treating an empty string as zero
+func parseOptionalDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d < 0 {
+		err = errors.New("negative duration")
+	}
+	return d, err
+}
+
+// parseQueryTime parses an RFC 3339 time or unix seconds, treating an empty string as the zero time
+func parseQueryTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,134 @@
+// Package handler provides HTTP handlers for cluster upgrade assessments
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// UpgradeAssessmentHandler handles deprecated API assessments of clusters
+type UpgradeAssessmentHandler struct {
+	db          *gorm.DB
+	assessments *service.UpgradeAssessmentService
+}
+
+// NewUpgradeAssessmentHandler creates a new upgrade assessment handler
+func NewUpgradeAssessmentHandler(db *gorm.DB, assessments *service.UpgradeAssessmentService) *UpgradeAssessmentHandler {
+	return &UpgradeAssessmentHandler{db: db, assessments: assessments}
+}
+
+// RunAssessment queues an assessment of the cluster for a target version
+// (POST /api/v1/clusters/{id}/upgrade-assessments)
+func (h *UpgradeAssessmentHandler) RunAssessment(w http.ResponseWriter, r *http.Request) {
+	userID, clusterID, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.RunUpgradeAssessmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	assessment, err := h.assessments.Run(userID, clusterID, &req)
+	if err != nil {
+		respondWithUpgradeAssessmentError(w, err, "Failed to run upgrade assessment")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": assessment,
+	})
+}
+
+// ListAssessments lists the cluster's assessments, newest first, up to ?limit
+// (GET /api/v1/clusters/{id}/upgrade-assessments)
+func (h *UpgradeAssessmentHandler) ListAssessments(w http.ResponseWriter, r *http.Request) {
+	_, clusterID, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	assessments, err := h.assessments.List(clusterID, limit)
+	if err != nil {
+		respondWithUpgradeAssessmentError(w, err, "Failed to list upgrade assessments")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  assessments,
+		"total": len(assessments),
+	})
+}
+
+// GetAssessment gets an assessment with its findings, or the cluster's most
+// recent one for "latest" (GET /api/v1/clusters/{id}/upgrade-assessments/{id|latest})
+func (h *UpgradeAssessmentHandler) GetAssessment(w http.ResponseWriter, r *http.Request) {
+	_, clusterID, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var assessment *model.ClusterUpgradeAssessmentResponse
+	var err error
+	if parts := splitPath(r.URL.Path); len(parts) > 5 && parts[5] == "latest" {
+		assessment, err = h.assessments.Latest(clusterID)
+	} else {
+		id, ok := pathUUID(w, r, 5, "assessment")
+		if !ok {
+			return
+		}
+		assessment, err = h.assessments.Get(clusterID, id)
+	}
+	if err != nil {
+		respondWithUpgradeAssessmentError(w, err, "Failed to get upgrade assessment")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": assessment,
+	})
+}
+
+// authorize checks the user owns the cluster or may get it
+func (h *UpgradeAssessmentHandler) authorize(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	clusterID, ok := pathUUID(w, r, 3, "cluster")
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	var cluster model.K8sCluster
+	if err := h.db.Select("id", "user_id").Where("id = ?", clusterID).First(&cluster).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+		return uuid.Nil, uuid.Nil, false
+	}
+	if cluster.UserID != userID && !requirePermission(w, h.db, userID, "clusters", "get", &clusterID, "cluster") {
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, clusterID, true
+}
+
+// respondWithUpgradeAssessmentError maps upgrade assessment service errors to responses
+func respondWithUpgradeAssessmentError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidUpgradeAssessment):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, service.ErrUpgradeClusterNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	case errors.Is(err, service.ErrUpgradeAssessmentNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Upgrade assessment not found")
+	default:
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fallback)
+	}
+}
@@ -0,0 +1,91 @@
+// Package handler provides the multipart streaming shared by upload endpoints
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxFormFieldSize limits each non-file field of a multipart upload
+const maxFormFieldSize = 1 << 20
+
+var (
+	// errNoFile is returned when a multipart upload has no file part
+	errNoFile = errors.New("no file uploaded")
+	// errStoreFailed wraps the errors of storing the file part
+	errStoreFailed = errors.New("failed to store upload")
+)
+
+// multipartUpload is what was read from a streamed multipart upload
+type multipartUpload struct {
+	Fields   map[string]string
+	FileName string
+}
+
+// readMultipartUpload streams a multipart request part by part, so uploads are
+// never buffered whole in memory or on disk by the form parser. The part named
+// fileField is passed to store as it arrives; the other parts are collected as
+// fields. It returns errNoFile when there is no file part, and wraps the errors
+// of store in errStoreFailed.
+func readMultipartUpload(r *http.Request, fileField string, store func(fileName string, file io.Reader) error) (*multipartUpload, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	upload := &multipartUpload{Fields: make(map[string]string)}
+	stored := false
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() == fileField && !stored {
+			upload.FileName = part.FileName()
+			if err = store(upload.FileName, part); err != nil {
+				err = fmt.Errorf("%w: %w", errStoreFailed, err)
+			}
+			stored = true
+		} else {
+			var value []byte
+			value, err = io.ReadAll(io.LimitReader(part, maxFormFieldSize+1))
+			if err == nil && len(value) > maxFormFieldSize {
+				err = fmt.Errorf("form field %s exceeds %d bytes", part.FormName(), maxFormFieldSize)
+			}
+			upload.Fields[part.FormName()] = string(value)
+		}
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !stored {
+		return nil, errNoFile
+	}
+	return upload, nil
+}
+
+// respondUploadError sends the response for an upload that could not be read:
+// 413 when it exceeded the body limit, 500 with code when it could not be
+// stored, otherwise 400
+func respondUploadError(w http.ResponseWriter, err error, code string) {
+	var maxBytes *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytes):
+		respondWithError(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE",
+			fmt.Sprintf("Upload exceeds the limit of %d bytes", maxBytes.Limit))
+	case errors.Is(err, errNoFile):
+		respondWithError(w, http.StatusBadRequest, "NO_FILE", "No file uploaded")
+	case errors.Is(err, errStoreFailed):
+		respondWithError(w, http.StatusInternalServerError, code, err.Error())
+	default:
+		respondWithError(w, http.StatusBadRequest, "INVALID_FORM", "Failed to parse form")
+	}
+}
@@ -0,0 +1,394 @@
+// Package handler provides HTTP handlers for Velero backups of managed clusters
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// veleroPrefix names the backups started through the platform
+const veleroPrefix = "myops-"
+
+// VeleroHandler installs Velero in managed clusters and manages their backups,
+// restores and backup schedules
+type VeleroHandler struct {
+	db     *gorm.DB
+	velero *service.VeleroService
+}
+
+// NewVeleroHandler creates a new Velero handler
+func NewVeleroHandler(db *gorm.DB, velero *service.VeleroService) *VeleroHandler {
+	return &VeleroHandler{db: db, velero: velero}
+}
+
+// GetStatus reports the platform's Velero installation, its Helm release and
+// whether Velero is running in the cluster
+func (h *VeleroHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	cluster, ok := h.cluster(w, r, "get")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err == nil {
+		defer client.Close()
+	}
+	status, err := h.velero.Status(ctx, client, cluster.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch Velero status")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": status,
+	})
+}
+
+// Install installs or reconfigures Velero in the cluster through its Helm release
+func (h *VeleroHandler) Install(w http.ResponseWriter, r *http.Request) {
+	cluster, ok := h.cluster(w, r, "update")
+	if !ok {
+		return
+	}
+	userID, _ := requestUserID(w, r)
+
+	var req model.InstallVeleroRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	installation, err := h.velero.Install(userID, cluster, &req)
+	if err != nil {
+		respondWithVeleroError(w, err, "Failed to install Velero")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": installation,
+	})
+}
+
+// ListBackups lists the cluster's Velero backups, newest first
+func (h *VeleroHandler) ListBackups(w http.ResponseWriter, r *http.Request) {
+	client, namespace, ok := h.clusterClient(w, r, "get")
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	backups, err := client.ListVeleroBackups(ctx, namespace)
+	if err != nil {
+		respondWithVeleroError(w, err, "Failed to list backups")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  backups,
+		"total": len(backups),
+	})
+}
+
+// CreateBackup starts a backup of the namespaces in the body, or of the whole cluster
+func (h *VeleroHandler) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	var spec k8s.VeleroBackupSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if err := h.velero.ValidateBackup(&spec); err != nil {
+		respondWithVeleroError(w, err, "")
+		return
+	}
+
+	client, namespace, ok := h.clusterClient(w, r, "update")
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	backup, err := client.CreateVeleroBackup(ctx, namespace, veleroPrefix, &spec)
+	if err != nil {
+		respondWithVeleroError(w, err, "Failed to start backup")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": backup,
+	})
+}
+
+// GetBackup gets a Velero backup
+func (h *VeleroHandler) GetBackup(w http.ResponseWriter, r *http.Request) {
+	client, namespace, ok := h.clusterClient(w, r, "get")
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	backup, err := client.GetVeleroBackup(ctx, namespace, splitPath(r.URL.Path)[6])
+	if err != nil {
+		respondWithVeleroError(w, err, "Failed to fetch backup")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": backup,
+	})
+}
+
+// DeleteBackup asks Velero to delete a backup and its data in object storage
+func (h *VeleroHandler) DeleteBackup(w http.ResponseWriter, r *http.Request) {
+	client, namespace, ok := h.clusterClient(w, r, "update")
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	if err := client.DeleteVeleroBackup(ctx, namespace, splitPath(r.URL.Path)[6]); err != nil {
+		respondWithVeleroError(w, err, "Failed to delete backup")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"message": "Backup deletion requested",
+	})
+}
+
+// ListRestores lists the cluster's Velero restores, newest first
+func (h *VeleroHandler) ListRestores(w http.ResponseWriter, r *http.Request) {
+	client, namespace, ok := h.clusterClient(w, r, "get")
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	restores, err := client.ListVeleroRestores(ctx, namespace)
+	if err != nil {
+		respondWithVeleroError(w, err, "Failed to list restores")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  restores,
+		"total": len(restores),
+	})
+}
+
+// CreateRestore restores namespaces from a completed backup
+func (h *VeleroHandler) CreateRestore(w http.ResponseWriter, r *http.Request) {
+	var spec k8s.VeleroRestoreSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if err := h.velero.ValidateRestore(&spec); err != nil {
+		respondWithVeleroError(w, err, "")
+		return
+	}
+
+	client, namespace, ok := h.clusterClient(w, r, "update")
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	restore, err := client.CreateVeleroRestore(ctx, namespace, &spec)
+	if err != nil {
+		respondWithVeleroError(w, err, "Failed to start restore")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": restore,
+	})
+}
+
+// ListSchedules lists the cluster's Velero backup schedules
+func (h *VeleroHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	client, namespace, ok := h.clusterClient(w, r, "get")
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	schedules, err := client.ListVeleroSchedules(ctx, namespace)
+	if err != nil {
+		respondWithVeleroError(w, err, "Failed to list schedules")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  schedules,
+		"total": len(schedules),
+	})
+}
+
+// CreateSchedule adds a schedule of recurring backups
+func (h *VeleroHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+		k8s.VeleroScheduleSpec
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if err := h.velero.ValidateSchedule(req.Name, &req.VeleroScheduleSpec); err != nil {
+		respondWithVeleroError(w, err, "")
+		return
+	}
+
+	client, namespace, ok := h.clusterClient(w, r, "update")
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	schedule, err := client.CreateVeleroSchedule(ctx, namespace, req.Name, &req.VeleroScheduleSpec)
+	if err != nil {
+		respondWithVeleroError(w, err, "Failed to create schedule")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"data": schedule,
+	})
+}
+
+// UpdateSchedule replaces a schedule's cron expression, backup template and pause
+func (h *VeleroHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	var spec k8s.VeleroScheduleSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	name := splitPath(r.URL.Path)[6]
+	if err := h.velero.ValidateSchedule(name, &spec); err != nil {
+		respondWithVeleroError(w, err, "")
+		return
+	}
+
+	client, namespace, ok := h.clusterClient(w, r, "update")
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	schedule, err := client.UpdateVeleroSchedule(ctx, namespace, name, &spec)
+	if err != nil {
+		respondWithVeleroError(w, err, "Failed to update schedule")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data": schedule,
+	})
+}
+
+// DeleteSchedule removes a schedule; the backups it took are kept
+func (h *VeleroHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	client, namespace, ok := h.clusterClient(w, r, "update")
+	if !ok {
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	if err := client.DeleteVeleroSchedule(ctx, namespace, splitPath(r.URL.Path)[6]); err != nil {
+		respondWithVeleroError(w, err, "Failed to delete schedule")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Schedule deleted successfully",
+	})
+}
+
+// cluster loads the cluster of the request. Cluster owners, and users holding
+// clusters.<action> on the cluster, may use its backups.
+func (h *VeleroHandler) cluster(w http.ResponseWriter, r *http.Request, action string) (*model.K8sCluster, bool) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return nil, false
+	}
+	clusterID, ok := pathUUID(w, r, 3, "cluster")
+	if !ok {
+		return nil, false
+	}
+
+	var cluster model.K8sCluster
+	if err := h.db.Where("id = ?", clusterID).First(&cluster).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+		return nil, false
+	}
+	if cluster.UserID != userID && !requirePermission(w, h.db, userID, "clusters", action, &clusterID, "cluster") {
+		return nil, false
+	}
+	return &cluster, true
+}
+
+// clusterClient connects to the cluster of the request and returns the namespace
+// Velero runs in
+func (h *VeleroHandler) clusterClient(w http.ResponseWriter, r *http.Request, action string) (*k8s.ClusterClient, string, bool) {
+	cluster, ok := h.cluster(w, r, action)
+	if !ok {
+		return nil, "", false
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "CLIENT_ERROR", "Failed to create cluster client")
+		return nil, "", false
+	}
+	return client, h.velero.Namespace(cluster.ID), true
+}
+
+// respondWithVeleroError maps Velero errors to responses
+func respondWithVeleroError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidVeleroRequest):
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+	case errors.Is(err, k8s.ErrVeleroNotInstalled):
+		respondWithError(w, http.StatusConflict, "VELERO_NOT_INSTALLED", err.Error())
+	case errors.Is(err, k8s.ErrVeleroNotFound):
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+	case errors.Is(err, k8s.ErrVeleroBackupIncomplete), errors.Is(err, k8s.ErrVeleroExists):
+		respondWithError(w, http.StatusConflict, "CONFLICT", err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, "FETCH_ERROR", fallback+": "+err.Error())
+	}
+}
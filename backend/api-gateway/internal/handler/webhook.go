@@ -0,0 +1,265 @@
+// Package handler provides HTTP handlers for outbound webhooks
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
+	"github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// WebhookHandler handles webhook endpoint and delivery operations
+type WebhookHandler struct {
+	db       *gorm.DB
+	webhooks *service.WebhookService
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(db *gorm.DB, webhooks *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{db: db, webhooks: webhooks}
+}
+
+// ListEventTypes returns the catalog of events endpoints can subscribe to
+func (h *WebhookHandler) ListEventTypes(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"events": model.EventCatalog,
+	})
+}
+
+// ============== Endpoint Management ==============
+
+// CreateEndpoint creates a webhook endpoint. The signing secret is only returned here.
+func (h *WebhookHandler) CreateEndpoint(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.CreateWebhookEndpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	endpoint, err := service.BuildWebhookEndpoint(userID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidWebhook) {
+			respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create webhook endpoint")
+		}
+		return
+	}
+	if err := h.db.Create(endpoint).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create webhook endpoint")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"endpoint": endpoint.Response(),
+		"secret":   endpoint.Secret,
+	})
+}
+
+// ListEndpoints lists the user's webhook endpoints
+func (h *WebhookHandler) ListEndpoints(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var endpoints []model.WebhookEndpoint
+	if err := h.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&endpoints).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch webhook endpoints")
+		return
+	}
+
+	responses := make([]model.WebhookEndpointResponse, 0, len(endpoints))
+	for i := range endpoints {
+		responses = append(responses, endpoints[i].Response())
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  responses,
+		"total": len(responses),
+	})
+}
+
+// GetEndpoint gets a webhook endpoint
+func (h *WebhookHandler) GetEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := h.ownedEndpoint(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, endpoint.Response())
+}
+
+// UpdateEndpoint updates a webhook endpoint
+func (h *WebhookHandler) UpdateEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := h.ownedEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.UpdateWebhookEndpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+	if err := service.ApplyWebhookUpdate(endpoint, &req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+
+	if err := h.db.Save(endpoint).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update webhook endpoint")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, endpoint.Response())
+}
+
+// DeleteEndpoint deletes a webhook endpoint and its delivery log
+func (h *WebhookHandler) DeleteEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := h.ownedEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	if err := db.DeleteWithChildren(h.db, endpoint, "endpoint_id", endpoint.ID, &model.WebhookDelivery{}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete webhook endpoint")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Webhook endpoint deleted successfully",
+	})
+}
+
+// PingEndpoint sends a test event to a webhook endpoint and returns the delivery
+func (h *WebhookHandler) PingEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := h.ownedEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhooks.Ping(endpoint)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, delivery)
+}
+
+// ============== Deliveries ==============
+
+// ListDeliveries lists an endpoint's deliveries, newest first
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := h.ownedEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	query := h.db.Model(&model.WebhookDelivery{}).Where("endpoint_id = ?", endpoint.ID)
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType := r.URL.Query().Get("event"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var deliveries []model.WebhookDelivery
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&deliveries).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch deliveries")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":     deliveries,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// RedriveDelivery sends a delivery again with a fresh set of retries
+func (h *WebhookHandler) RedriveDelivery(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	parts := splitPath(r.URL.Path)
+	if len(parts) != 6 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return
+	}
+	deliveryID, err := uuid.Parse(parts[4])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid delivery ID format")
+		return
+	}
+
+	delivery, err := h.webhooks.Redrive(userID, deliveryID)
+	if err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Delivery not found")
+		case errors.Is(err, service.ErrInvalidWebhook):
+			respondWithError(w, http.StatusConflict, "CONFLICT", err.Error())
+		default:
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to redrive delivery")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, delivery)
+}
+
+// ownedEndpoint resolves the endpoint in the URL path and checks that the user owns it
+func (h *WebhookHandler) ownedEndpoint(w http.ResponseWriter, r *http.Request) (*model.WebhookEndpoint, bool) {
+	pathParts := splitPath(r.URL.Path)
+	if len(pathParts) < 5 {
+		respondWithError(w, http.StatusBadRequest, "INVALID_PATH", "Invalid URL path")
+		return nil, false
+	}
+
+	endpointID, err := uuid.Parse(pathParts[4])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid endpoint ID format")
+		return nil, false
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	var endpoint model.WebhookEndpoint
+	if err := h.db.Where("id = ? AND user_id = ?", endpointID, userID).First(&endpoint).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Webhook endpoint not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch webhook endpoint")
+		}
+		return nil, false
+	}
+
+	return &endpoint, true
+}
@@ -4,11 +4,11 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -18,12 +18,6 @@ import (
 	"gorm.io/gorm"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for now
-	},
-}
-
 // PodLogsWebSocketHandler handles websocket connections for pod log streaming
 type PodLogsWebSocketHandler struct {
 	db *gorm.DB
@@ -36,8 +30,13 @@ func NewPodLogsWebSocketHandler(db *gorm.DB) *PodLogsWebSocketHandler {
 
 // ServeHTTP handles websocket upgrade for pod logs
 func (h *PodLogsWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, userID, ok := authenticateWebSocket(w, r)
+	if !ok {
+		return
+	}
+
 	// Upgrade to websocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := upgradeWebSocket(w, r, userID)
 	if err != nil {
 		return
 	}
@@ -63,22 +62,12 @@ func (h *PodLogsWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Get user ID from context (if available)
-	var userID uuid.UUID
-	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
-		if uid, ok := userIDVal.(string); ok {
-			userID, _ = uuid.Parse(uid)
-		}
-	}
-
-	if userID == (uuid.UUID{}) {
-		conn.WriteMessage(websocket.TextMessage, []byte("Error: User not authenticated"))
+	// Check access to the namespace
+	cluster, err := namespaceCluster(h.db, userID, clusterUUID, namespace, "pods", "logs")
+	if errors.Is(err, errNamespaceDenied) {
+		conn.WriteMessage(websocket.TextMessage, []byte("Error: Permission pods.logs required in namespace "+namespace))
 		return
-	}
-
-	// Verify cluster ownership
-	var cluster model.K8sCluster
-	if err := h.db.Where("id = ? AND user_id = ?", clusterUUID, userID).First(&cluster).Error; err != nil {
+	} else if err != nil {
 		conn.WriteMessage(websocket.TextMessage, []byte("Error: Cluster not found"))
 		return
 	}
@@ -104,23 +93,27 @@ func (h *PodLogsWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 	}
 	defer client.Close()
 
+	audit := auditSessionOpen(h.db, r, conn, userID, auditSessionPodLogs, model.ResourceCluster, clusterUUID.String(), map[string]interface{}{
+		"clusterId": clusterUUID,
+		"namespace": namespace,
+		"pod":       podName,
+		"container": containerName,
+		"follow":    follow,
+		"tailLines": tailLines,
+	})
+	var sessionErr error
+	defer func() { audit.close(sessionErr) }()
+
 	// Stream logs
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Handle ping/pong for connection keepalive
+	// Client messages are not used; reading notices the client closing or going idle
 	go func() {
-		ticker := time.NewTicker(30 * time.Second)
-		defer ticker.Stop()
+		defer cancel()
 		for {
-			select {
-			case <-ctx.Done():
+			if _, _, err := conn.ReadMessage(); err != nil {
 				return
-			case <-ticker.C:
-				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-					cancel()
-					return
-				}
 			}
 		}
 	}()
@@ -128,12 +121,14 @@ func (h *PodLogsWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 	if follow {
 		// Follow mode - stream logs continuously
 		if err := streamPodLogsFollow(ctx, conn, client, namespace, podName, containerName, tailLines); err != nil {
+			sessionErr = err
 			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Error: %v", err)))
 		}
 	} else {
 		// Static mode - get logs once
 		logs, err := client.GetPodLogs(ctx, namespace, podName, tailLines)
 		if err != nil {
+			sessionErr = err
 			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Error: %v", err)))
 			return
 		}
@@ -142,7 +137,7 @@ func (h *PodLogsWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 }
 
 // streamPodLogsFollow streams pod logs in follow mode
-func streamPodLogsFollow(ctx context.Context, conn *websocket.Conn, client *k8s.ClusterClient, namespace, podName, containerName string, tailLines int64) error {
+func streamPodLogsFollow(ctx context.Context, conn *wsConn, client *k8s.ClusterClient, namespace, podName, containerName string, tailLines int64) error {
 	req := client.GetPodLogStream(namespace, podName, containerName, tailLines)
 	if req == nil {
 		return fmt.Errorf("failed to create log stream request")
@@ -201,8 +196,13 @@ func NewPodTerminalWebSocketHandler(db *gorm.DB) *PodTerminalWebSocketHandler {
 
 // ServeHTTP handles websocket upgrade for pod terminal
 func (h *PodTerminalWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, userID, ok := authenticateWebSocket(w, r)
+	if !ok {
+		return
+	}
+
 	// Upgrade to websocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := upgradeWebSocket(w, r, userID)
 	if err != nil {
 		return
 	}
@@ -230,22 +230,12 @@ func (h *PodTerminalWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	// Get user ID from context (if available)
-	var userID uuid.UUID
-	if userIDVal := r.Context().Value("user_id"); userIDVal != nil {
-		if uid, ok := userIDVal.(string); ok {
-			userID, _ = uuid.Parse(uid)
-		}
-	}
-
-	if userID == (uuid.UUID{}) {
-		conn.WriteJSON(TerminalMessage{Type: "error", Data: "User not authenticated"})
+	// Check access to the namespace
+	cluster, err := namespaceCluster(h.db, userID, clusterUUID, namespace, "pods", "terminal")
+	if errors.Is(err, errNamespaceDenied) {
+		conn.WriteJSON(TerminalMessage{Type: "error", Data: "Permission pods.terminal required in namespace " + namespace})
 		return
-	}
-
-	// Verify cluster ownership
-	var cluster model.K8sCluster
-	if err := h.db.Where("id = ? AND user_id = ?", clusterUUID, userID).First(&cluster).Error; err != nil {
+	} else if err != nil {
 		conn.WriteJSON(TerminalMessage{Type: "error", Data: "Cluster not found"})
 		return
 	}
@@ -263,27 +253,20 @@ func (h *PodTerminalWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.R
 	}
 	defer client.Close()
 
+	audit := auditSessionOpen(h.db, r, conn, userID, auditSessionPodTerminal, model.ResourceCluster, clusterUUID.String(), map[string]interface{}{
+		"clusterId": clusterUUID,
+		"namespace": namespace,
+		"pod":       podName,
+		"container": containerName,
+		"shell":     shell,
+	})
+	var sessionErr error
+	defer func() { audit.close(sessionErr) }()
+
 	// Create terminal session
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Handle ping/pong for connection keepalive
-	go func() {
-		ticker := time.NewTicker(30 * time.Second)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-					cancel()
-					return
-				}
-			}
-		}
-	}()
-
 	// Create exec configuration
 	execConfig := &k8s.ExecConfig{
 		Namespace: namespace,
@@ -299,6 +282,7 @@ func (h *PodTerminalWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.R
 	// Get executor
 	executor, err := client.PodExec(ctx, execConfig)
 	if err != nil {
+		sessionErr = err
 		conn.WriteJSON(TerminalMessage{Type: "error", Data: fmt.Sprintf("Failed to create executor: %v", err)})
 		return
 	}
@@ -353,6 +337,7 @@ func (h *PodTerminalWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.R
 
 	// Start exec session
 	if err := executor.StreamWithContext(ctx, streamOptions); err != nil {
+		sessionErr = err
 		conn.WriteJSON(TerminalMessage{Type: "error", Data: fmt.Sprintf("Exec session error: %v", err)})
 		return
 	}
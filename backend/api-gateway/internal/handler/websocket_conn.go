@@ -0,0 +1,341 @@
+// Package handler provides the connection handling shared by websocket endpoints
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/wangjialin/myops/pkg/auth/jwt"
+)
+
+// wsTokenProtocol is offered by browsers as the first subprotocol followed by the
+// access token, since they cannot set an Authorization header on a websocket
+const wsTokenProtocol = "bearer"
+
+// WebSocketConfig holds the limits applied to every websocket connection
+type WebSocketConfig struct {
+	// AllowedOrigins may open connections besides pages served from the gateway's
+	// own host; requests without an Origin header are not from browsers and pass.
+	// AllowOrigin, when set, is asked about the other origins too.
+	AllowedOrigins  []string
+	AllowOrigin     func(origin string) bool
+	PingInterval    time.Duration
+	PongWait        time.Duration // Connections silent for this long are closed
+	WriteWait       time.Duration
+	MaxMessageSize  int64
+	MaxConnsPerUser int
+}
+
+// WebSocketManager authenticates websocket upgrades, applies the connection limits
+// and keeps the open connections alive until they close or the gateway shuts down
+type WebSocketManager struct {
+	tokens   *jwt.Manager
+	config   WebSocketConfig
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	counts   map[uuid.UUID]int
+	conns    map[*wsConn]struct{}
+	shutdown bool
+}
+
+// NewWebSocketManager creates a websocket manager validating access tokens with tokens
+func NewWebSocketManager(tokens *jwt.Manager, config WebSocketConfig) *WebSocketManager {
+	m := &WebSocketManager{
+		tokens: tokens,
+		config: config,
+		counts: make(map[uuid.UUID]int),
+		conns:  make(map[*wsConn]struct{}),
+	}
+	m.upgrader = websocket.Upgrader{
+		ReadBufferSize:  8192,
+		WriteBufferSize: 8192,
+		Subprotocols:    []string{wsTokenProtocol},
+		CheckOrigin:     m.checkOrigin,
+	}
+	return m
+}
+
+// webSocketManager is the manager every websocket endpoint upgrades through
+var webSocketManager *WebSocketManager
+
+// RegisterWebSocketManager registers the websocket manager
+func RegisterWebSocketManager(m *WebSocketManager) {
+	webSocketManager = m
+}
+
+// Authenticate identifies the user opening a websocket from the access token in
+// the Authorization header, the bearer subprotocol or the token parameter,
+// and returns r with the user in its context. A request without a token keeps the
+// user set by earlier middleware, if any. It sends 401 when no user is found.
+func (m *WebSocketManager) Authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, uuid.UUID, bool) {
+	token := webSocketToken(r)
+	if token == "" {
+		userID, ok := requestUserID(w, r)
+		return r, userID, ok
+	}
+
+	if m.tokens == nil {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid or expired token")
+		return r, uuid.Nil, false
+	}
+	claims, err := m.tokens.ValidateAccessToken(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid or expired token")
+		return r, uuid.Nil, false
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid or expired token")
+		return r, uuid.Nil, false
+	}
+
+	ctx := context.WithValue(r.Context(), "user_id", userID.String())
+	ctx = context.WithValue(ctx, "username", claims.Username)
+	return r.WithContext(ctx), userID, true
+}
+
+// Upgrade upgrades an authenticated request once the user is below the connection
+// limit. The connection is pinged every PingInterval and fails reads once the
+// client has been silent for PongWait. On error the response has been sent.
+func (m *WebSocketManager) Upgrade(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (*wsConn, error) {
+	m.mu.Lock()
+	if m.shutdown {
+		m.mu.Unlock()
+		respondWithError(w, http.StatusServiceUnavailable, "SHUTTING_DOWN", "Server is shutting down")
+		return nil, errors.New("server is shutting down")
+	}
+	if m.config.MaxConnsPerUser > 0 && m.counts[userID] >= m.config.MaxConnsPerUser {
+		m.mu.Unlock()
+		respondWithError(w, http.StatusTooManyRequests, "TOO_MANY_CONNECTIONS",
+			fmt.Sprintf("At most %d websocket connections per user", m.config.MaxConnsPerUser))
+		return nil, errors.New("websocket connection limit reached")
+	}
+	m.counts[userID]++
+	m.mu.Unlock()
+
+	// Upgrade replies itself when the origin is refused or the handshake is invalid
+	raw, err := m.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		m.release(userID)
+		return nil, err
+	}
+
+	conn := &wsConn{Conn: raw, manager: m, userID: userID, done: make(chan struct{})}
+	m.mu.Lock()
+	m.conns[conn] = struct{}{}
+	m.mu.Unlock()
+
+	if m.config.MaxMessageSize > 0 {
+		raw.SetReadLimit(m.config.MaxMessageSize)
+	}
+	conn.extendReadDeadline()
+	raw.SetPongHandler(func(string) error {
+		conn.extendReadDeadline()
+		return nil
+	})
+	go conn.keepalive()
+	return conn, nil
+}
+
+// Shutdown refuses new connections and closes the open ones with 1001 (going
+// away), since http.Server.Shutdown neither waits for nor closes websockets
+func (m *WebSocketManager) Shutdown() {
+	m.mu.Lock()
+	m.shutdown = true
+	conns := make([]*wsConn, 0, len(m.conns))
+	for conn := range m.conns {
+		conns = append(conns, conn)
+	}
+	m.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.CloseWith(websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+func (m *WebSocketManager) release(userID uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counts[userID]--; m.counts[userID] <= 0 {
+		delete(m.counts, userID)
+	}
+}
+
+func (m *WebSocketManager) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range m.config.AllowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	return m.config.AllowOrigin != nil && m.config.AllowOrigin(origin)
+}
+
+// webSocketToken returns the access token a websocket request carries, if any
+func webSocketToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	if protocols := websocket.Subprotocols(r); len(protocols) >= 2 && protocols[0] == wsTokenProtocol {
+		return protocols[1]
+	}
+	return r.URL.Query().Get("token")
+}
+
+// authenticateWebSocket authenticates r with the registered websocket manager
+func authenticateWebSocket(w http.ResponseWriter, r *http.Request) (*http.Request, uuid.UUID, bool) {
+	if webSocketManager == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "WebSocket connections are not available")
+		return r, uuid.Nil, false
+	}
+	return webSocketManager.Authenticate(w, r)
+}
+
+// upgradeWebSocket upgrades r with the registered websocket manager
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (*wsConn, error) {
+	if webSocketManager == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "WebSocket connections are not available")
+		return nil, errors.New("websocket connections are not available")
+	}
+	return webSocketManager.Upgrade(w, r, userID)
+}
+
+// wsConn is a websocket connection opened through the WebSocketManager. Writes are
+// serialised and bounded by WriteWait, so any goroutine may write; reads extend
+// the idle timeout. Close sends a close frame before closing the connection.
+// Data message bytes are counted each way for the audit log.
+type wsConn struct {
+	*websocket.Conn
+	manager *WebSocketManager
+	userID  uuid.UUID
+
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// WriteMessage writes a data message
+func (c *wsConn) WriteMessage(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.Conn.SetWriteDeadline(time.Now().Add(c.manager.config.WriteWait))
+	if err := c.Conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	c.bytesOut.Add(int64(len(data)))
+	return nil
+}
+
+// WriteJSON writes v as a JSON text message
+func (c *wsConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+// ReadMessage reads the next data message
+func (c *wsConn) ReadMessage() (int, []byte, error) {
+	messageType, data, err := c.Conn.ReadMessage()
+	if err != nil {
+		c.readFailed(err)
+		return messageType, data, err
+	}
+	c.bytesIn.Add(int64(len(data)))
+	c.extendReadDeadline()
+	return messageType, data, nil
+}
+
+// ReadJSON reads the next message as JSON into v
+func (c *wsConn) ReadJSON(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Close closes the connection with 1000 (normal closure)
+func (c *wsConn) Close() error {
+	return c.CloseWith(websocket.CloseNormalClosure, "")
+}
+
+// CloseWith sends a close frame with code and reason, then closes the connection.
+// Only the first close has any effect.
+func (c *wsConn) CloseWith(code int, reason string) error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.done)
+		message := websocket.FormatCloseMessage(code, reason)
+		c.Conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(c.manager.config.WriteWait))
+		err = c.Conn.Close()
+
+		c.manager.mu.Lock()
+		delete(c.manager.conns, c)
+		c.manager.mu.Unlock()
+		c.manager.release(c.userID)
+	})
+	return err
+}
+
+// readFailed closes a connection whose client went silent with 1008 (policy
+// violation) so the client can tell an idle timeout from a dropped connection
+func (c *wsConn) readFailed(err error) {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		c.CloseWith(websocket.ClosePolicyViolation, "idle timeout")
+	}
+}
+
+func (c *wsConn) extendReadDeadline() {
+	if c.manager.config.PongWait > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.manager.config.PongWait))
+	}
+}
+
+// keepalive pings the client every PingInterval until the connection closes
+func (c *wsConn) keepalive() {
+	if c.manager.config.PingInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.manager.config.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.manager.config.WriteWait)); err != nil {
+				c.Close()
+				return
+			}
+		}
+	}
+}
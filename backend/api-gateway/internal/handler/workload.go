@@ -3,19 +3,26 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/wangjialin/myops/api-gateway/internal/service"
 	"github.com/wangjialin/myops/pkg/k8s"
 	"github.com/wangjialin/myops/pkg/model"
 	"gorm.io/gorm"
 )
 
+// podUsageHistoryWindow is how far back the pod detail usage series reaches
+const podUsageHistoryWindow = time.Hour
+
 // WorkloadHandler handles Kubernetes workload operations
 type WorkloadHandler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	caches *service.ClusterCacheService
 }
 
 // NewWorkloadHandler creates a new workload handler
@@ -23,6 +30,12 @@ func NewWorkloadHandler(db *gorm.DB) *WorkloadHandler {
 	return &WorkloadHandler{db: db}
 }
 
+// SetClusterCache sets the informer caches deployment, pod and service lists
+// are served from. Without them every list is read from the cluster.
+func (h *WorkloadHandler) SetClusterCache(caches *service.ClusterCacheService) {
+	h.caches = caches
+}
+
 // ListNamespaces handles namespace list requests
 func (h *WorkloadHandler) ListNamespaces(w http.ResponseWriter, r *http.Request) {
 	// Get cluster ID from URL path
@@ -51,10 +64,10 @@ func (h *WorkloadHandler) ListNamespaces(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Verify cluster ownership
-	var cluster model.K8sCluster
-	if err := h.db.Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
-		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	// Check access to the cluster; users without cluster-wide access only see
+	// the namespaces they are bound to
+	cluster, visible, ok := h.authorizeCluster(w, userID, clusterID)
+	if !ok {
 		return
 	}
 
@@ -72,7 +85,7 @@ func (h *WorkloadHandler) ListNamespaces(w http.ResponseWriter, r *http.Request)
 	defer client.Close()
 
 	// Get namespaces
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
 	namespaces, err := client.GetNamespaces(ctx)
@@ -80,6 +93,15 @@ func (h *WorkloadHandler) ListNamespaces(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusInternalServerError, "FETCH_ERROR", "Failed to fetch namespaces")
 		return
 	}
+	if visible != nil {
+		filtered := make([]string, 0, len(visible))
+		for _, ns := range namespaces {
+			if visible[ns] {
+				filtered = append(filtered, ns)
+			}
+		}
+		namespaces = filtered
+	}
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"data": namespaces,
@@ -116,10 +138,9 @@ func (h *WorkloadHandler) ListDeployments(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Verify cluster ownership
-	var cluster model.K8sCluster
-	if err := h.db.Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
-		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	// Check access to the namespace
+	cluster, ok := h.authorizeNamespace(w, userID, clusterID, namespace, "workloads", "list")
+	if !ok {
 		return
 	}
 
@@ -137,17 +158,18 @@ func (h *WorkloadHandler) ListDeployments(w http.ResponseWriter, r *http.Request
 	defer client.Close()
 
 	// Get deployments
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	deployments, err := getDeployments(ctx, client, namespace)
+	deployments, freshness, err := getDeployments(ctx, h.caches, cluster, client, namespace)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "FETCH_ERROR", "Failed to fetch deployments")
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"data": deployments,
+		"data":  deployments,
+		"cache": freshness,
 	})
 }
 
@@ -181,10 +203,9 @@ func (h *WorkloadHandler) ListPods(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify cluster ownership
-	var cluster model.K8sCluster
-	if err := h.db.Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
-		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	// Check access to the namespace
+	cluster, ok := h.authorizeNamespace(w, userID, clusterID, namespace, "pods", "list")
+	if !ok {
 		return
 	}
 
@@ -202,17 +223,18 @@ func (h *WorkloadHandler) ListPods(w http.ResponseWriter, r *http.Request) {
 	defer client.Close()
 
 	// Get pods
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	pods, err := getPods(ctx, client, namespace)
+	pods, freshness, err := getPods(ctx, h.caches, cluster, client, namespace)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "FETCH_ERROR", "Failed to fetch pods")
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"data": pods,
+		"data":  pods,
+		"cache": freshness,
 	})
 }
 
@@ -246,10 +268,9 @@ func (h *WorkloadHandler) ListServices(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify cluster ownership
-	var cluster model.K8sCluster
-	if err := h.db.Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
-		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	// Check access to the namespace
+	cluster, ok := h.authorizeNamespace(w, userID, clusterID, namespace, "workloads", "list")
+	if !ok {
 		return
 	}
 
@@ -267,17 +288,18 @@ func (h *WorkloadHandler) ListServices(w http.ResponseWriter, r *http.Request) {
 	defer client.Close()
 
 	// Get services
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	services, err := getServices(ctx, client, namespace)
+	services, freshness, err := getServices(ctx, h.caches, cluster, client, namespace)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "FETCH_ERROR", "Failed to fetch services")
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"data": services,
+		"data":  services,
+		"cache": freshness,
 	})
 }
 
@@ -320,10 +342,9 @@ func (h *WorkloadHandler) GetPodLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify cluster ownership
-	var cluster model.K8sCluster
-	if err := h.db.Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
-		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	// Check access to the namespace
+	cluster, ok := h.authorizeNamespace(w, userID, clusterID, namespace, "pods", "logs")
+	if !ok {
 		return
 	}
 
@@ -341,7 +362,7 @@ func (h *WorkloadHandler) GetPodLogs(w http.ResponseWriter, r *http.Request) {
 	defer client.Close()
 
 	// Get pod logs
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
 	logs, err := getPodLogs(ctx, client, namespace, podName, tailLines)
@@ -394,10 +415,9 @@ func (h *WorkloadHandler) DeletePod(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify cluster ownership
-	var cluster model.K8sCluster
-	if err := h.db.Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
-		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	// Check access to the namespace
+	cluster, ok := h.authorizeNamespace(w, userID, clusterID, namespace, "pods", "delete")
+	if !ok {
 		return
 	}
 
@@ -414,10 +434,22 @@ func (h *WorkloadHandler) DeletePod(w http.ResponseWriter, r *http.Request) {
 	}
 	defer client.Close()
 
-	// Delete pod
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
+	// Access policies can select pods by label, so check against the pod itself
+	podLabels, err := h.caches.PodLabels(ctx, cluster, client, namespace, podName)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Pod not found")
+		return
+	}
+	if !objectAllowed(h.db, userID, cluster, namespace, "pods", "delete", podLabels) {
+		respondWithError(w, http.StatusForbidden, "PERMISSION_DENIED",
+			fmt.Sprintf("Permission pods.delete denied for pod %s", podName))
+		return
+	}
+
+	// Delete pod
 	if err := deletePod(ctx, client, namespace, podName); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "DELETE_ERROR", "Failed to delete pod")
 		return
@@ -460,10 +492,9 @@ func (h *WorkloadHandler) GetPodDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify cluster ownership
-	var cluster model.K8sCluster
-	if err := h.db.Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
-		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+	// Check access to the namespace
+	cluster, ok := h.authorizeNamespace(w, userID, clusterID, namespace, "pods", "get")
+	if !ok {
 		return
 	}
 
@@ -481,7 +512,7 @@ func (h *WorkloadHandler) GetPodDetail(w http.ResponseWriter, r *http.Request) {
 	defer client.Close()
 
 	// Get pod detail
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
 	podDetail, err := client.GetPodDetail(ctx, namespace, podName)
@@ -490,18 +521,109 @@ func (h *WorkloadHandler) GetPodDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Recent usage comes from the collected pod snapshots
+	since := time.Now().Add(-podUsageHistoryWindow).Unix()
+	h.db.Model(&model.PodMetric{}).
+		Select("timestamp, cpu_usage_cores, memory_usage_bytes").
+		Where("cluster_id = ? AND namespace = ? AND pod_name = ? AND timestamp >= ?", clusterID, namespace, podName, since).
+		Order("timestamp ASC").
+		Scan(&podDetail.UsageHistory)
+
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"data": podDetail,
 	})
 }
 
-// Helper functions for Kubernetes operations
+// authorizeCluster resolves the cluster of a cluster-wide request. visible is nil
+// when the user may see every namespace, otherwise it holds the namespaces the user
+// is bound to.
+func (h *WorkloadHandler) authorizeCluster(w http.ResponseWriter, userID, clusterID uuid.UUID) (*model.K8sCluster, map[string]bool, bool) {
+	var cluster model.K8sCluster
+	if err := h.db.Where("id = ?", clusterID).First(&cluster).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+		return nil, nil, false
+	}
+	if cluster.UserID == userID || model.UserHasPermission(h.db, userID, "workloads", "list", &clusterID, "cluster").Allowed {
+		return &cluster, nil, true
+	}
 
-func getDeployments(ctx context.Context, client *k8s.ClusterClient, namespace string) ([]map[string]interface{}, error) {
-	deployments, err := client.GetDeployments(ctx, namespace)
+	namespaces, err := boundNamespaces(h.db, userID, clusterID)
 	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to check namespace access")
+		return nil, nil, false
+	}
+	if len(namespaces) == 0 {
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+		return nil, nil, false
+	}
+	visible := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		visible[ns] = true
+	}
+	return &cluster, visible, true
+}
+
+// authorizeNamespace resolves the cluster of a request in namespace and checks the
+// user may perform resource.action there
+func (h *WorkloadHandler) authorizeNamespace(w http.ResponseWriter, userID, clusterID uuid.UUID, namespace, resource, action string) (*model.K8sCluster, bool) {
+	cluster, err := namespaceCluster(h.db, userID, clusterID, namespace, resource, action)
+	switch {
+	case errors.Is(err, errNamespaceDenied):
+		respondWithError(w, http.StatusForbidden, "PERMISSION_DENIED",
+			fmt.Sprintf("Permission %s.%s required in namespace %s", resource, action, namespace))
+		return nil, false
+	case err != nil:
+		respondWithError(w, http.StatusNotFound, "NOT_FOUND", "Cluster not found")
+		return nil, false
+	}
+	return cluster, true
+}
+
+// errNamespaceDenied is returned when a user may not act in a namespace
+var errNamespaceDenied = errors.New("permission denied in namespace")
+
+// namespaceCluster loads a cluster for a request in namespace. Cluster owners have
+// full access; other users need the resource.action permission in the namespace,
+// for example through a namespace binding.
+func namespaceCluster(db *gorm.DB, userID, clusterID uuid.UUID, namespace, resource, action string) (*model.K8sCluster, error) {
+	var cluster model.K8sCluster
+	if err := db.Where("id = ?", clusterID).First(&cluster).Error; err != nil {
 		return nil, err
 	}
+	if cluster.UserID == userID {
+		return &cluster, nil
+	}
+	if !model.UserHasNamespacePermission(db, userID, resource, action, clusterID, namespace).Allowed {
+		return nil, errNamespaceDenied
+	}
+	return &cluster, nil
+}
+
+// objectAllowed checks resource.action on a Kubernetes object in namespace,
+// matching access policy selectors against the labels of the object. Cluster
+// owners are only refused by a deny policy.
+func objectAllowed(db *gorm.DB, userID uuid.UUID, cluster *model.K8sCluster, namespace, resource, action string, objectLabels map[string]string) bool {
+	result := model.UserHasObjectPermission(db, userID, resource, action, cluster.ID, namespace, objectLabels)
+	return result.Allowed || (cluster.UserID == userID && result.Source != "policy")
+}
+
+// boundNamespaces returns the namespaces of a cluster the user holds unexpired role bindings in
+func boundNamespaces(db *gorm.DB, userID, clusterID uuid.UUID) ([]string, error) {
+	var namespaces []string
+	err := db.Model(&model.UserRole{}).
+		Where("user_id = ? AND resource_type = ? AND resource_id = ? AND namespace <> ''", userID, "cluster", clusterID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Distinct().Pluck("namespace", &namespaces).Error
+	return namespaces, err
+}
+
+// Helper functions for Kubernetes operations
+
+func getDeployments(ctx context.Context, caches *service.ClusterCacheService, cluster *model.K8sCluster, client *k8s.ClusterClient, namespace string) ([]map[string]interface{}, *k8s.CacheFreshness, error) {
+	deployments, freshness, err := caches.Deployments(ctx, cluster, client, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	result := make([]map[string]interface{}, len(deployments))
 	for i, d := range deployments {
@@ -516,13 +638,13 @@ func getDeployments(ctx context.Context, client *k8s.ClusterClient, namespace st
 			"createdAt":         d.CreatedAt,
 		}
 	}
-	return result, nil
+	return result, freshness, nil
 }
 
-func getPods(ctx context.Context, client *k8s.ClusterClient, namespace string) ([]map[string]interface{}, error) {
-	pods, err := client.GetPods(ctx, namespace)
+func getPods(ctx context.Context, caches *service.ClusterCacheService, cluster *model.K8sCluster, client *k8s.ClusterClient, namespace string) ([]map[string]interface{}, *k8s.CacheFreshness, error) {
+	pods, freshness, err := caches.Pods(ctx, cluster, client, namespace)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	result := make([]map[string]interface{}, len(pods))
@@ -541,13 +663,13 @@ func getPods(ctx context.Context, client *k8s.ClusterClient, namespace string) (
 			"createdAt":    p.CreatedAt,
 		}
 	}
-	return result, nil
+	return result, freshness, nil
 }
 
-func getServices(ctx context.Context, client *k8s.ClusterClient, namespace string) ([]map[string]interface{}, error) {
-	services, err := client.GetServices(ctx, namespace)
+func getServices(ctx context.Context, caches *service.ClusterCacheService, cluster *model.K8sCluster, client *k8s.ClusterClient, namespace string) ([]map[string]interface{}, *k8s.CacheFreshness, error) {
+	services, freshness, err := caches.Services(ctx, cluster, client, namespace)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	result := make([]map[string]interface{}, len(services))
@@ -561,7 +683,7 @@ func getServices(ctx context.Context, client *k8s.ClusterClient, namespace strin
 			"createdAt":  s.CreatedAt,
 		}
 	}
-	return result, nil
+	return result, freshness, nil
 }
 
 func getPodLogs(ctx context.Context, client *k8s.ClusterClient, namespace, podName string, tailLines int64) (string, error) {
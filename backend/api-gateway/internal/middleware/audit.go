@@ -3,6 +3,7 @@ package middleware
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"log"
 	"net/http"
@@ -23,16 +24,25 @@ func AuditMiddleware(db *gorm.DB) func(http.Handler) http.Handler {
 			// Capture response writer to get status code
 			rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
 
-			// Read body for non-GET requests (for tracking changes)
+			// Read body for non-GET requests (for tracking changes). Uploads are
+			// streamed by their handlers and never held in memory.
 			var bodyBytes []byte
-			if r.Method != http.MethodGet && r.Method != http.MethodHead {
-				bodyBytes, _ = io.ReadAll(r.Body)
+			var bodyErr error
+			if r.Method != http.MethodGet && r.Method != http.MethodHead &&
+				!strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+				bodyBytes, bodyErr = io.ReadAll(r.Body)
 				// Restore body for downstream handlers
 				r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 			}
 
-			// Call next handler
-			next.ServeHTTP(rw, r)
+			// Call next handler, unless the body was over its limit
+			var maxBytes *http.MaxBytesError
+			if errors.As(bodyErr, &maxBytes) {
+				respondBodyTooLarge(rw, bodyErr)
+				bodyBytes = nil
+			} else {
+				next.ServeHTTP(rw, r)
+			}
 
 			// Skip logging for health checks and static assets
 			if shouldSkipLogging(r) {
@@ -96,7 +106,7 @@ func AuditMiddleware(db *gorm.DB) func(http.Handler) http.Handler {
 // shouldSkipLogging determines if a request should be skipped from audit logging
 func shouldSkipLogging(r *http.Request) bool {
 	// Skip health checks
-	if r.URL.Path == "/health" {
+	if r.URL.Path == "/health" || strings.HasPrefix(r.URL.Path, "/health/") {
 		return true
 	}
 
@@ -105,6 +115,12 @@ func shouldSkipLogging(r *http.Request) bool {
 		return true
 	}
 
+	// Skip public dashboard links, whose path holds the link token; their
+	// accesses are recorded with the link
+	if strings.HasPrefix(r.URL.Path, "/api/v1/public/dashboards/") {
+		return true
+	}
+
 	// Skip favicon
 	if r.URL.Path == "/favicon.ico" {
 		return true
@@ -188,8 +204,10 @@ func getIPAddress(r *http.Request) string {
 
 // extractErrorInfo extracts error information from response
 func extractErrorInfo(rw *responseWriter) string {
-	// Try to read response body if it contains error details
-	// This is a simplified version
+	// Handlers record the error they respond with
+	if rw.errorCode != "" {
+		return rw.errorCode + ": " + rw.errorMessage
+	}
 	return "Request failed"
 }
 
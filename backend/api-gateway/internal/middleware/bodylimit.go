@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// UploadRoutes are the paths taking file uploads. Multipart requests to them get
+// the upload body limit; everything else gets the JSON one.
+var UploadRoutes = []string{
+	"/api/v1/files/upload",
+	"/api/v1/batch-tasks/distributions",
+}
+
+// BodyLimits holds the largest request body accepted per route class, which can
+// be changed while the server runs
+type BodyLimits struct {
+	json   atomic.Int64
+	upload atomic.Int64
+}
+
+// NewBodyLimits creates body limits of jsonBytes and uploadBytes
+func NewBodyLimits(jsonBytes, uploadBytes int64) *BodyLimits {
+	l := &BodyLimits{}
+	l.Set(jsonBytes, uploadBytes)
+	return l
+}
+
+// Set changes the limits; a limit that is not positive is left as it is
+func (l *BodyLimits) Set(jsonBytes, uploadBytes int64) {
+	if jsonBytes > 0 {
+		l.json.Store(jsonBytes)
+	}
+	if uploadBytes > 0 {
+		l.upload.Store(uploadBytes)
+	}
+}
+
+// limit returns the body limit of the route class of r
+func (l *BodyLimits) limit(r *http.Request) int64 {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		for _, route := range UploadRoutes {
+			if r.URL.Path == route {
+				return l.upload.Load()
+			}
+		}
+	}
+	return l.json.Load()
+}
+
+// BodyLimit caps request bodies at the limit of their route class. Bodies
+// declaring a larger Content-Length are refused up front; others fail to read
+// past the limit with an *http.MaxBytesError, which handlers answer with 413.
+func BodyLimit(limits *BodyLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := limits.limit(r)
+			if r.ContentLength > limit {
+				respondBodyTooLarge(w, &http.MaxBytesError{Limit: limit})
+				return
+			}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// respondBodyTooLarge sends 413 for a body read past its limit, saying what the
+// limit is
+func respondBodyTooLarge(w http.ResponseWriter, err error) {
+	message := "Request body too large"
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		message = fmt.Sprintf("Request body exceeds the limit of %d bytes", maxBytes.Limit)
+	}
+	respondWithError(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", message)
+}
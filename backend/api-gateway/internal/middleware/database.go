@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/logging"
+)
+
+// unavailableWriter replaces a server error answered while the database is
+// unavailable with the standard 503 response
+type unavailableWriter struct {
+	http.ResponseWriter
+	guard      *db.Guard
+	wroteHead  bool
+	suppressed bool
+}
+
+func (uw *unavailableWriter) WriteHeader(code int) {
+	if uw.wroteHead {
+		return
+	}
+	uw.wroteHead = true
+	if code >= http.StatusInternalServerError && uw.guard.State() != db.GuardClosed {
+		uw.suppressed = true
+		writeDatabaseUnavailable(uw.ResponseWriter, uw.guard)
+		return
+	}
+	uw.ResponseWriter.WriteHeader(code)
+}
+
+func (uw *unavailableWriter) Write(b []byte) (int, error) {
+	uw.WriteHeader(http.StatusOK)
+	if uw.suppressed {
+		return len(b), nil
+	}
+	return uw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to hijack it
+func (uw *unavailableWriter) Unwrap() http.ResponseWriter {
+	return uw.ResponseWriter
+}
+
+// DatabaseAvailability answers 503 with Retry-After while guard's circuit breaker
+// is open: writes are refused before reaching a handler, and server errors from
+// handlers that failed to reach the database are replaced with the same response
+func DatabaseAvailability(guard *db.Guard) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if guard == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				if !guard.Available() {
+					writeDatabaseUnavailable(w, guard)
+					return
+				}
+			}
+			next.ServeHTTP(&unavailableWriter{ResponseWriter: w, guard: guard}, r)
+		})
+	}
+}
+
+func writeDatabaseUnavailable(w http.ResponseWriter, guard *db.Guard) {
+	logging.RecordError(w, "DATABASE_UNAVAILABLE", "The database is temporarily unavailable")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(int(guard.RetryAfter().Seconds())))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(w, `{"error":{"code":"DATABASE_UNAVAILABLE","message":"The database is temporarily unavailable, retry later"},"requestId":"%s"}`, logging.ResponseRequestID(w))
+}
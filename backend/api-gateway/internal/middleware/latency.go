@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// LatencyRecorder keeps how long the requests of each route took
+type LatencyRecorder interface {
+	Observe(route string, duration time.Duration)
+}
+
+// Path segments kept in a route: words and API versions. Anything else, such
+// as an ID or a name, is replaced by *.
+var routeSegment = regexp.MustCompile(`^(?:[a-z][a-z_-]*|v[0-9]+)$`)
+
+// Latency records how long each request took under its route, its method and
+// path with IDs replaced, and logs requests taking slowRequest or longer with
+// the statements they ran. Websockets and event streams, which stay open, are
+// not timed.
+func Latency(recorder LatencyRecorder, slowRequest time.Duration, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+				strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			ctx, timings := db.WithQueryTimings(r.Context())
+			ww := &responseWriter{
+				ResponseWriter: w,
+				status:         http.StatusOK,
+			}
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			elapsed := time.Since(start)
+			route := r.Method + " " + RoutePattern(r.URL.Path)
+			recorder.Observe(route, elapsed)
+			if slowRequest <= 0 || elapsed < slowRequest {
+				return
+			}
+
+			count, total, slowest := timings.Summary()
+			logger.Warn("slow request",
+				zap.String("request_id", logging.RequestID(ctx)),
+				zap.String("method", r.Method),
+				zap.String("route", route),
+				zap.String("path", r.URL.Path),
+				zap.Int("status", ww.status),
+				zap.Duration("latency", elapsed),
+				zap.Int("db_queries", count),
+				zap.Duration("db_time", total),
+				zap.Any("slowest_queries", slowest))
+		})
+	}
+}
+
+// RoutePattern returns the route a request path belongs to, its IDs and names
+// replaced by *, e.g. /api/v1/hosts/* for /api/v1/hosts/<uuid>
+func RoutePattern(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if segment != "" && !routeSegment.MatchString(segment) {
+			segments[i] = "*"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// LogSlowQuery logs a statement that ran for too long, with the request it ran
+// for. Its parameters are left out.
+func LogSlowQuery(logger *zap.Logger) func(ctx context.Context, q db.QueryTiming) {
+	return func(ctx context.Context, q db.QueryTiming) {
+		fields := []zap.Field{
+			zap.String("sql", q.SQL),
+			zap.Int64("rows", q.Rows),
+			zap.Duration("duration", q.Duration),
+		}
+		if requestID := logging.RequestID(ctx); requestID != "" {
+			fields = append(fields, zap.String("request_id", requestID))
+		}
+		if q.Err != nil {
+			fields = append(fields, zap.Error(q.Err))
+		}
+		logger.Warn("slow query", fields...)
+	}
+}
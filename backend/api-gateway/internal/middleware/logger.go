@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/wangjialin/myops/pkg/logging"
 	"go.uber.org/zap"
 )
 
@@ -12,6 +13,10 @@ type responseWriter struct {
 	http.ResponseWriter
 	status  int
 	written bool
+
+	// The error the response reports, as recorded by the handler
+	errorCode    string
+	errorMessage string
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -27,15 +32,34 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
 
-// Logger logs all HTTP requests
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to hijack it
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// RecordError keeps the error the response reports for the request log
+func (rw *responseWriter) RecordError(code, message string) {
+	rw.errorCode = code
+	rw.errorMessage = message
+}
+
+// Logger logs all HTTP requests. Each request is given a correlation ID, the
+// one the client sent in X-Request-ID when it is valid, which is returned in
+// the X-Request-ID response header and error bodies, carried in the request's
+// context to the calls made for it, and logged with the request. Server errors
+// are logged as errors and client errors as warnings, with the error reported.
 func Logger(logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			requestID := generateRequestID()
+			requestID := r.Header.Get(logging.RequestIDHeader)
+			if !logging.ValidRequestID(requestID) {
+				requestID = logging.NewRequestID()
+			}
+			w.Header().Set(logging.RequestIDHeader, requestID)
 
 			// Add request ID to context
-			r = r.WithContext(contextWithRequestID(r.Context(), requestID))
+			r = r.WithContext(logging.WithRequestID(r.Context(), requestID))
 
 			ww := &responseWriter{
 				ResponseWriter: w,
@@ -44,7 +68,7 @@ func Logger(logger *zap.Logger) func(http.Handler) http.Handler {
 
 			next.ServeHTTP(ww, r)
 
-			logger.Info("request completed",
+			fields := []zap.Field{
 				zap.String("request_id", requestID),
 				zap.String("method", r.Method),
 				zap.String("path", r.URL.Path),
@@ -53,23 +77,25 @@ func Logger(logger *zap.Logger) func(http.Handler) http.Handler {
 				zap.Duration("latency", time.Since(start)),
 				zap.String("remote_addr", r.RemoteAddr),
 				zap.String("user_agent", r.UserAgent()),
-			)
+			}
+			if ww.errorCode != "" {
+				fields = append(fields,
+					zap.String("error_code", ww.errorCode),
+					zap.String("error_message", ww.errorMessage))
+			}
+			switch {
+			case ww.status >= http.StatusInternalServerError:
+				logger.Error("request failed", fields...)
+			case ww.status >= http.StatusBadRequest:
+				logger.Warn("request rejected", fields...)
+			default:
+				logger.Info("request completed", fields...)
+			}
 		})
 	}
 }
 
-type contextKey string
-
-const requestIDKey contextKey = "request_id"
-
-func contextWithRequestID(ctx context.Context, requestID string) context.Context {
-	return context.WithValue(ctx, requestIDKey, requestID)
-}
-
 // GetRequestID retrieves the request ID from context
 func GetRequestID(ctx context.Context) string {
-	if requestID, ok := ctx.Value(requestIDKey).(string); ok {
-		return requestID
-	}
-	return ""
+	return logging.RequestID(ctx)
 }
@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/wangjialin/myops/pkg/logging"
 	"golang.org/x/time/rate"
 )
 
@@ -40,6 +41,19 @@ func (rl *IPRateLimiter) GetLimiter(ip string) *rate.Limiter {
 	return limiter
 }
 
+// SetLimit changes the rate and burst for new and already tracked IPs
+func (rl *IPRateLimiter) SetLimit(r rate.Limit, b int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.r = r
+	rl.b = b
+	for _, limiter := range rl.ips {
+		limiter.SetLimit(r)
+		limiter.SetBurst(b)
+	}
+}
+
 // RateLimit implements IP-based rate limiting using token bucket algorithm
 // 100 requests per minute with burst of 10
 func RateLimit(next http.Handler) http.Handler {
@@ -47,15 +61,23 @@ func RateLimit(next http.Handler) http.Handler {
 		rate.Every(time.Minute/100), // 100 req/min
 		10,                           // burst
 	)
+	return RateLimitWith(limiter)(next)
+}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := r.RemoteAddr
-		if !limiter.GetLimiter(ip).Allow() {
-			w.WriteHeader(http.StatusTooManyRequests)
-			w.Header().Set("Content-Type", "application/json")
-			fmt.Fprintf(w, `{"error":{"code":"RATE_LIMIT_EXCEEDED","message":"Too many requests"},"requestId":"%s"}`, generateRequestID())
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+// RateLimitWith implements IP-based rate limiting with limiter, whose limits can be
+// changed while the server runs
+func RateLimitWith(limiter *IPRateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := r.RemoteAddr
+			if !limiter.GetLimiter(ip).Allow() {
+				logging.RecordError(w, "RATE_LIMIT_EXCEEDED", "Too many requests")
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"error":{"code":"RATE_LIMIT_EXCEEDED","message":"Too many requests"},"requestId":"%s"}`, logging.ResponseRequestID(w))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
 }
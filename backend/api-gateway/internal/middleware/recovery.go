@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"runtime/debug"
 
+	"github.com/wangjialin/myops/pkg/logging"
 	"go.uber.org/zap"
 )
 
@@ -16,6 +17,7 @@ func Recovery(logger *zap.Logger) func(http.Handler) http.Handler {
 			defer func() {
 				if err := recover(); err != nil {
 					logger.Error("panic recovered",
+						zap.String("request_id", w.Header().Get(logging.RequestIDHeader)),
 						zap.Any("error", err),
 						zap.String("stack", string(debug.Stack())),
 						zap.String("method", r.Method),
@@ -23,7 +25,7 @@ func Recovery(logger *zap.Logger) func(http.Handler) http.Handler {
 					)
 
 					w.WriteHeader(http.StatusInternalServerError)
-					fmt.Fprintf(w, `{"error":{"code":"INTERNAL_ERROR","message":"Internal Server Error"},"requestId":"%s"}`, generateRequestID())
+					fmt.Fprintf(w, `{"error":{"code":"INTERNAL_ERROR","message":"Internal Server Error"},"requestId":"%s"}`, logging.ResponseRequestID(w))
 				}
 			}()
 			next.ServeHTTP(w, r)
@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CSRFCookie carries the token browsers echo in CSRFHeader. It is readable by
+	// scripts so pages served from the gateway's site can send it back.
+	CSRFCookie = "myops_csrf"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// SecurityPolicy holds the CORS origins, security headers and CSRF protection
+// applied to every response, which can be changed while the server runs
+type SecurityPolicy struct {
+	mu         sync.RWMutex
+	origins    []string
+	csp        string
+	hstsMaxAge time.Duration
+	csrf       bool
+}
+
+// NewSecurityPolicy creates a policy allowing origins, without a content
+// security policy or HSTS, with CSRF protection enabled
+func NewSecurityPolicy(origins []string) *SecurityPolicy {
+	p := &SecurityPolicy{csrf: true}
+	p.SetOrigins(origins)
+	return p
+}
+
+// SetOrigins changes the origins allowed to call the API from browsers
+func (p *SecurityPolicy) SetOrigins(origins []string) {
+	allowed := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			allowed = append(allowed, origin)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.origins = allowed
+}
+
+// SetHeaders changes the Content-Security-Policy, none when empty, and the
+// HSTS max age, sent on HTTPS requests unless 0
+func (p *SecurityPolicy) SetHeaders(csp string, hstsMaxAge time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.csp = csp
+	p.hstsMaxAge = hstsMaxAge
+}
+
+// SetCSRF enables or disables CSRF protection
+func (p *SecurityPolicy) SetCSRF(enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.csrf = enabled
+}
+
+// AllowedOrigin reports whether origin may call the API from browsers
+func (p *SecurityPolicy) AllowedOrigin(origin string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, allowed := range p.origins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *SecurityPolicy) headers() (string, time.Duration) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.csp, p.hstsMaxAge
+}
+
+func (p *SecurityPolicy) csrfEnabled() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.csrf
+}
+
+// CORSWith handles Cross-Origin Resource Sharing for the origins of policy
+func CORSWith(policy *SecurityPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			if origin != "" && policy.AllowedOrigin(origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+CSRFHeader)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				w.Header().Set("Access-Control-Max-Age", "86400")
+			}
+
+			// Handle preflight requests
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SecurityHeaders sets the standard security headers of policy on every
+// response. HSTS is only sent over HTTPS, where browsers honour it.
+func SecurityHeaders(policy *SecurityPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			csp, hstsMaxAge := policy.headers()
+			header := w.Header()
+			header.Set("X-Content-Type-Options", "nosniff")
+			header.Set("X-Frame-Options", "DENY")
+			header.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+			if csp != "" {
+				header.Set("Content-Security-Policy", csp)
+			}
+			if hstsMaxAge > 0 && isSecureRequest(r) {
+				header.Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", int64(hstsMaxAge.Seconds())))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CSRF protects cookie-based sessions with a double-submit token: a request
+// changing state that carries cookies must repeat the CSRFCookie value in the
+// CSRFHeader. Requests with an Authorization header cannot be forged by another
+// site and websockets check their origin at upgrade, so both pass.
+func CSRF(policy *SecurityPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !policy.csrfEnabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cookie, err := r.Cookie(CSRFCookie)
+			if err != nil || cookie.Value == "" {
+				issueCSRFToken(w, r)
+			}
+
+			if isSafeMethod(r.Method) ||
+				r.Header.Get(authorizationHeader) != "" ||
+				strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+				len(r.Cookies()) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token := r.Header.Get(CSRFHeader)
+			if cookie == nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) != 1 {
+				respondWithError(w, http.StatusForbidden, "CSRF_TOKEN_INVALID", "Missing or invalid CSRF token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// issueCSRFToken sets a new CSRF token cookie on the response
+func issueCSRFToken(w http.ResponseWriter, r *http.Request) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    hex.EncodeToString(buf),
+		Path:     "/",
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
@@ -7,9 +7,13 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	stdredis "github.com/redis/go-redis/v9"
+	"github.com/wangjialin/myops/api-gateway/internal/agentrpc"
 	"github.com/wangjialin/myops/api-gateway/internal/config"
 	"github.com/wangjialin/myops/api-gateway/internal/handler"
 	"github.com/wangjialin/myops/api-gateway/internal/middleware"
@@ -18,7 +22,9 @@ import (
 	ldapauth "github.com/wangjialin/myops/pkg/auth/ldap"
 	"github.com/wangjialin/myops/pkg/auth/redis"
 	"github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/model"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 	"gorm.io/gorm"
 )
 
@@ -29,12 +35,115 @@ type Server struct {
 	config     *config.Config
 	db         *gorm.DB
 	redis      *stdredis.Client
+
+	health   *service.HealthService
+	workers  *service.WorkerMonitor
+	settings *service.SettingsService
+	flags    *service.FeatureFlagService
+
+	metricsCollector *service.ClusterMetricsCollector
+	costService      *service.CostService
+	stopCollector    context.CancelFunc
+
+	webhooks     *service.WebhookService
+	stopWebhooks context.CancelFunc
+
+	ticketing     *service.TicketingService
+	stopTicketing context.CancelFunc
+
+	heartbeats     *service.HostHeartbeatService
+	stopHeartbeats context.CancelFunc
+
+	directorySync     *service.DirectorySyncService
+	stopDirectorySync context.CancelFunc
+
+	prometheusQueries     *service.PrometheusQueryService
+	stopPrometheusQueries context.CancelFunc
+
+	operations     *service.OperationService
+	stopOperations context.CancelFunc
+
+	jobs     *service.JobQueue
+	stopJobs context.CancelFunc
+
+	reports     *service.ReportService
+	stopReports context.CancelFunc
+
+	dataExports     *service.DataExportService
+	stopDataExports context.CancelFunc
+
+	slos     *service.SLOService
+	stopSLOs context.CancelFunc
+
+	synthetics     *service.SyntheticService
+	stopSynthetics context.CancelFunc
+
+	certificates     *service.CertificateService
+	stopCertificates context.CancelFunc
+
+	networkDiagnostics     *service.NetworkDiagnosticService
+	stopNetworkDiagnostics context.CancelFunc
+
+	remoteWrite     *service.RemoteWriteService
+	stopRemoteWrite context.CancelFunc
+
+	clusterCredentials     *service.ClusterCredentialService
+	stopClusterCredentials context.CancelFunc
+
+	compliance     *service.ComplianceService
+	stopCompliance context.CancelFunc
+
+	backups     *service.BackupService
+	stopBackups context.CancelFunc
+
+	hostAnomalies     *service.HostAnomalyService
+	stopHostAnomalies context.CancelFunc
+
+	topology     *service.TopologyService
+	stopTopology context.CancelFunc
+
+	search     *service.SearchService
+	stopSearch context.CancelFunc
+
+	notificationDigests     *service.NotificationService
+	stopNotificationDigests context.CancelFunc
+
+	auditChain     *service.AuditChainService
+	stopAuditChain context.CancelFunc
+
+	appCatalog     *service.AppCatalogService
+	stopAppCatalog context.CancelFunc
+
+	gitOps     *service.GitOpsService
+	stopGitOps context.CancelFunc
+
+	canaries     *service.CanaryRolloutService
+	stopCanaries context.CancelFunc
+
+	resourceWatches     *service.ResourceWatchService
+	stopResourceWatches context.CancelFunc
+
+	clusterCaches     *service.ClusterCacheService
+	stopClusterCaches context.CancelFunc
+
+	routeLatency     *service.RouteLatencyService
+	stopRouteLatency context.CancelFunc
+
+	webSockets *handler.WebSocketManager
+
+	agentRPC *agentrpc.Server
+
+	stopSettings context.CancelFunc
 }
 
 // New creates a new HTTP server
 func New(cfg *config.Config, logger *zap.Logger) *Server {
 	mux := http.NewServeMux()
 
+	// Keep the recent errors for the diagnostics bundle
+	errorLog := service.NewErrorLog(500)
+	logger = errorLog.Tee(logger)
+
 	// TODO: Initialize dependencies
 	// For now, create nil dependencies (service will handle nil gracefully)
 	var gormDB *gorm.DB
@@ -42,6 +151,27 @@ func New(cfg *config.Config, logger *zap.Logger) *Server {
 	var privateKey *rsa.PrivateKey
 	var publicKey *rsa.PublicKey
 
+	// Route statements through a guard that tracks connection health, retries
+	// reads and refuses writes while the database is unreachable
+	var dbGuard *db.Guard
+	if gormDB != nil {
+		guard, err := db.NewGuard(gormDB, db.GuardConfig{
+			FailureThreshold: cfg.Database.FailureThreshold,
+			Cooldown:         cfg.Database.BreakerCooldown,
+			ReadRetries:      cfg.Database.ReadRetries,
+			RetryBackoff:     cfg.Database.RetryBackoff,
+		})
+		if err != nil {
+			logger.Error("failed to install database guard", zap.Error(err))
+		}
+		dbGuard = guard
+	}
+
+	// Time the statements of each request and log the slow ones
+	if gormDB != nil {
+		db.TimeQueries(gormDB, cfg.Latency.SlowQuery, middleware.LogSlowQuery(logger))
+	}
+
 	// Create repositories
 	var userRepo *db.UserRepository
 	if gormDB != nil {
@@ -94,49 +224,482 @@ func New(cfg *config.Config, logger *zap.Logger) *Server {
 	var workloadHandler *handler.WorkloadHandler
 	var podLogsWSHandler *handler.PodLogsWebSocketHandler
 	var podTerminalWSHandler *handler.PodTerminalWebSocketHandler
+	var resourceWatches *service.ResourceWatchService
+	var resourceWatchHandler *handler.ResourceWatchHandler
+	var clusterCaches *service.ClusterCacheService
 	var helmHandler *handler.HelmHandler
 	var otelHandler *handler.OtelHandler
 	var prometheusHandler *handler.PrometheusHandler
 	var grafanaHandler *handler.GrafanaHandler
+	var traceHandler *handler.TraceHandler
+	var logHandler *handler.LogHandler
+	var exploreHandler *handler.ExploreHandler
 	var aiAnalysisHandler *handler.AIAnalysisHandler
 	var alertHandler *handler.AlertHandler
+	var alertGroupHandler *handler.AlertGroupHandler
+	var maintenanceHandler *handler.MaintenanceHandler
+	var runbookHandler *handler.RunbookHandler
+	var webhookHandler *handler.WebhookHandler
+	var ticketingHandler *handler.TicketingHandler
+	var chatOpsHandler *handler.ChatOpsHandler
+	var alertEmailHandler *handler.AlertEmailHandler
+	var eventStreamHandler *handler.EventStreamHandler
 	var auditHandler *handler.AuditHandler
 	var performanceHandler *handler.PerformanceHandler
 	var notificationHandler *handler.NotificationHandler
 	var userManagementHandler *handler.UserManagementHandler
 	var rbacHandler *handler.RBACHandler
+	var costHandler *handler.CostHandler
+	var metricsCollector *service.ClusterMetricsCollector
+	var costService *service.CostService
+	var webhookService *service.WebhookService
+	var ticketing *service.TicketingService
+	var alertEngine *service.AlertEngine
+	var heartbeatService *service.HostHeartbeatService
+	var settingsService *service.SettingsService
+	var settingsHandler *handler.SettingsHandler
+	var featureFlags *service.FeatureFlagService
+	var featureFlagHandler *handler.FeatureFlagHandler
+	var ssoService *service.SSOService
+	var directorySync *service.DirectorySyncService
+	var prometheusQueries *service.PrometheusQueryService
+	var operations *service.OperationService
+	var operationHandler *handler.OperationHandler
+	var jobs *service.JobQueue
+	var jobQueueHandler *handler.JobQueueHandler
+	var reports *service.ReportService
+	var reportHandler *handler.ReportHandler
+	var dataExports *service.DataExportService
+	var dataExportHandler *handler.DataExportHandler
+	var annotations *service.AnnotationService
+	var annotationHandler *handler.AnnotationHandler
+	var slos *service.SLOService
+	var sloHandler *handler.SLOHandler
+	var synthetics *service.SyntheticService
+	var syntheticHandler *handler.SyntheticHandler
+	var certificates *service.CertificateService
+	var certificateHandler *handler.CertificateHandler
+	var networkDiagnostics *service.NetworkDiagnosticService
+	var networkDiagnosticHandler *handler.NetworkDiagnosticHandler
+	var remoteWrite *service.RemoteWriteService
+	var remoteWriteHandler *handler.RemoteWriteHandler
+	var agentRPC *agentrpc.Server
+	var agentPluginHandler *handler.AgentPluginHandler
+	var clusterConnectorHandler *handler.ClusterConnectorHandler
+	var clusterCredentials *service.ClusterCredentialService
+	var clusterCredentialHandler *handler.ClusterCredentialHandler
+	var clusterKubeconfigHandler *handler.ClusterKubeconfigHandler
+	var upgradeAssessmentHandler *handler.UpgradeAssessmentHandler
+	var nodeMaintenanceHandler *handler.NodeMaintenanceHandler
+	var clusterFanoutHandler *handler.ClusterFanoutHandler
+	var clusterRBACHandler *handler.ClusterRBACHandler
+	var portForwardHandler *handler.PortForwardHandler
+	var imageHandler *handler.ImageHandler
+	var compliance *service.ComplianceService
+	var complianceHandler *handler.ComplianceHandler
+	var backups *service.BackupService
+	var backupHandler *handler.BackupHandler
+	var hostAnomalies *service.HostAnomalyService
+	var topology *service.TopologyService
+	var topologyHandler *handler.TopologyHandler
+	var search *service.SearchService
+	var searchHandler *handler.SearchHandler
+	var tagHandler *handler.TagHandler
+	var hostBulkHandler *handler.HostBulkHandler
+	var hostLifecycleHandler *handler.HostLifecycleHandler
+	var notificationDigests *service.NotificationService
+	var auditChain *service.AuditChainService
+	var appCatalog *service.AppCatalogService
+	var appCatalogHandler *handler.AppCatalogHandler
+	var gitOps *service.GitOpsService
+	var gitOpsHandler *handler.GitOpsHandler
+	var pipelineHandler *handler.DeploymentPipelineHandler
+	var canaries *service.CanaryRolloutService
+	var canaryHandler *handler.CanaryRolloutHandler
+	var veleroHandler *handler.VeleroHandler
+	var directorySyncHandler *handler.DirectorySyncHandler
+	var scimHandler *handler.ScimHandler
+	var namespaceBindingHandler *handler.NamespaceBindingHandler
+	var permissionTraceHandler *handler.PermissionTraceHandler
+	var accountHandler *handler.AccountHandler
+	var quotaService *service.QuotaService
+	var dashboardShareHandler *handler.DashboardShareHandler
+
+	// Rate limits can be changed at runtime through settings
+	rateLimiter := middleware.NewIPRateLimiter(rate.Every(time.Minute/100), 10)
+
+	// So can the CORS origins, security headers and CSRF protection
+	securityPolicy := middleware.NewSecurityPolicy(cfg.Security.CORSOrigins)
+
+	// And the request body limits: 1MB for JSON, 1GB for uploads
+	bodyLimits := middleware.NewBodyLimits(1<<20, 1<<30)
+
 	if gormDB != nil {
+		settingsService = service.NewSettingsService(gormDB, logger)
+		settingsService.SetDefault(model.SettingLLMBaseURL, cfg.LLM.BaseURL)
+		settingsService.SetDefault(model.SettingLLMAPIKey, cfg.LLM.APIKey)
+		settingsService.SetDefault(model.SettingLLMModel, cfg.LLM.Model)
+		settingsService.SetDefault(model.SettingMetricsRetention, cfg.Metrics.Retention.String())
+		settingsService.SetDefault(model.SettingSecurityCORSOrigins, strings.Join(cfg.Security.CORSOrigins, ","))
+		settingsService.SetDefault(model.SettingLDAPEnabled, strconv.FormatBool(cfg.LDAP.URL != ""))
+		settingsService.SetDefault(model.SettingLDAPURL, cfg.LDAP.URL)
+		settingsService.SetDefault(model.SettingLDAPBindDN, cfg.LDAP.BindDN)
+		settingsService.SetDefault(model.SettingLDAPBindPassword, cfg.LDAP.BindPassword)
+		settingsService.SetDefault(model.SettingLDAPBaseDN, cfg.LDAP.BaseDN)
+		if cfg.LDAP.UserFilter != "" {
+			settingsService.SetDefault(model.SettingLDAPUserFilter, cfg.LDAP.UserFilter)
+		}
+		if err := settingsService.Refresh(); err != nil {
+			logger.Error("failed to load settings", zap.Error(err))
+		}
+		settingsHandler = handler.NewSettingsHandler(gormDB, settingsService)
+		featureFlags = service.NewFeatureFlagService(gormDB, logger)
+		if err := featureFlags.Refresh(); err != nil {
+			logger.Error("failed to load feature flags", zap.Error(err))
+		}
+		featureFlagHandler = handler.NewFeatureFlagHandler(gormDB, featureFlags)
+		ssoService = service.NewSSOService(gormDB, logger, settingsService)
+		authService.SetSSO(ssoService)
+		directorySync = service.NewDirectorySyncService(gormDB, logger, settingsService, ssoService)
+		directorySyncHandler = handler.NewDirectorySyncHandler(gormDB, directorySync, settingsService)
+		scimHandler = handler.NewScimHandler(service.NewScimService(gormDB, logger, settingsService, ssoService))
+		namespaceBindingHandler = handler.NewNamespaceBindingHandler(gormDB, service.NewNamespaceBindingService(gormDB))
+		permissionTraceHandler = handler.NewPermissionTraceHandler(gormDB)
+		accountService := service.NewAccountService(gormDB, logger, settingsService, service.NewMailer(settingsService))
+		authService.SetAccounts(accountService)
+		accountHandler = handler.NewAccountHandler(gormDB, accountService, authService)
+		quotaService = service.NewQuotaService(gormDB, settingsService)
+		applyRateLimit := func(string, string) {
+			perMinute := settingsService.Int(model.SettingRateLimitPerMinute)
+			burst := settingsService.Int(model.SettingRateLimitBurst)
+			if perMinute > 0 && burst > 0 {
+				rateLimiter.SetLimit(rate.Every(time.Minute/time.Duration(perMinute)), burst)
+			}
+		}
+		applyRateLimit("", "")
+		settingsService.Watch(model.SettingRateLimitPerMinute, applyRateLimit)
+		settingsService.Watch(model.SettingRateLimitBurst, applyRateLimit)
+
+		applySecurityPolicy := func(string, string) {
+			securityPolicy.SetOrigins(strings.Split(settingsService.String(model.SettingSecurityCORSOrigins), ","))
+			securityPolicy.SetHeaders(settingsService.String(model.SettingSecurityCSP), settingsService.Duration(model.SettingSecurityHSTSMaxAge))
+			securityPolicy.SetCSRF(settingsService.Bool(model.SettingSecurityCSRFEnabled))
+		}
+		applySecurityPolicy("", "")
+		for _, key := range []string{model.SettingSecurityCORSOrigins, model.SettingSecurityCSP, model.SettingSecurityHSTSMaxAge, model.SettingSecurityCSRFEnabled} {
+			settingsService.Watch(key, applySecurityPolicy)
+		}
+
+		applyBodyLimits := func(string, string) {
+			bodyLimits.Set(int64(settingsService.Int(model.SettingLimitJSONBodyBytes)), int64(settingsService.Int(model.SettingLimitUploadBodyBytes)))
+		}
+		applyBodyLimits("", "")
+		settingsService.Watch(model.SettingLimitJSONBodyBytes, applyBodyLimits)
+		settingsService.Watch(model.SettingLimitUploadBodyBytes, applyBodyLimits)
+
+		eventBus := service.NewEventBus(logger)
+		eventStreamHandler = handler.NewEventStreamHandler(gormDB, eventBus)
+		webhookService = service.NewWebhookService(gormDB, logger)
+		eventBus.Handle(webhookService.HandleEvent)
+		operations = service.NewOperationService(gormDB, logger, settingsService)
+		operations.SetEventBus(eventBus)
+		operationHandler = handler.NewOperationHandler(operations)
+		jobs = service.NewJobQueue(gormDB, logger, settingsService)
+		jobQueueHandler = handler.NewJobQueueHandler(gormDB, jobs)
+		reports = service.NewReportService(gormDB, logger, settingsService, jobs)
+		reports.SetEventBus(eventBus)
+		reportHandler = handler.NewReportHandler(gormDB, reports)
+		dataExports = service.NewDataExportService(gormDB, logger, settingsService, jobs)
+		dataExportHandler = handler.NewDataExportHandler(gormDB, dataExports)
+		annotations = service.NewAnnotationService(gormDB)
+		annotationHandler = handler.NewAnnotationHandler(gormDB, annotations)
+		webhookHandler = handler.NewWebhookHandler(gormDB, webhookService)
 		hostHandler = handler.NewHostHandler(gormDB)
+		hostHandler.SetEventBus(eventBus)
 		scanHandler = handler.NewScanHandler(gormDB)
+		scanHandler.SetOperations(operations)
 		agentHandler = handler.NewAgentHandler(gormDB)
+		agentHandler.SetSharedAgentToken(cfg.Hosts.AgentToken)
+		heartbeatService = service.NewHostHeartbeatService(gormDB, logger, cfg.Hosts.DegradedAfter, cfg.Hosts.OfflineAfter)
+		heartbeatService.SetEventBus(eventBus)
+		agentHandler.SetHeartbeatService(heartbeatService)
+		remoteWrite = service.NewRemoteWriteService(gormDB, logger)
+		remoteWriteHandler = handler.NewRemoteWriteHandler(gormDB, remoteWrite)
+		agentHandler.SetRemoteWriteService(remoteWrite)
+		hostAnomalies = service.NewHostAnomalyService(gormDB, logger)
+		hostAnomalies.SetEventBus(eventBus)
+		hostAnomalies.SetFeatureFlags(featureFlags)
+		hostAnomalies.SetSettings(settingsService)
+		agentHandler.SetHostAnomalyService(hostAnomalies)
+		agentPlugins := service.NewAgentPluginService(gormDB, agentHandler.Commands())
+		agentHandler.SetPluginService(agentPlugins)
+		agentPluginHandler = handler.NewAgentPluginHandler(gormDB, agentPlugins)
+		hostLifecycle := service.NewHostLifecycleService(gormDB, logger)
+		hostLifecycle.SetEventBus(eventBus)
+		agentHandler.SetLifecycleService(hostLifecycle)
+		hostLifecycleHandler = handler.NewHostLifecycleHandler(gormDB, hostLifecycle, agentHandler.Reports())
+		if cfg.AgentRPC.Port > 0 {
+			var err error
+			agentRPC, err = agentrpc.NewServer(agentHandler.Reports(), agentHandler.Commands(), cfg.AgentRPC, logger)
+			if err != nil {
+				logger.Error("failed to create agent RPC server, agents report over HTTP", zap.Error(err))
+			}
+		}
 		sshWSHandler = handler.NewSSHWebSocketHandler(gormDB, nil) // TODO: pass proper logger
 		fileHandler = handler.NewFileTransferHandler(gormDB)
 		processHandler = handler.NewProcessManagementHandler(gormDB)
+		processHandler.SetFeatureFlags(featureFlags)
 		batchTaskHandler = handler.NewBatchTaskHandler(gormDB, logger)
-		clusterHandler = handler.NewClusterHandler(gormDB)
-		clusterMetricsHandler = handler.NewClusterMetricsHandler(gormDB)
+		batchTaskHandler.SetEventBus(eventBus)
+		batchTaskHandler.SetOperations(operations)
+		clusterRepo := db.NewClusterRepository(gormDB)
+		dataSourceRepo := db.NewDataSourceRepository(gormDB)
+		clusterHandler = handler.NewClusterHandler(service.NewClusterService(clusterRepo, service.DialCluster, logger))
+		clusterConnectorHandler = handler.NewClusterConnectorHandler(gormDB, service.NewClusterConnectorService(gormDB, logger))
+		clusterCredentials = service.NewClusterCredentialService(gormDB, logger, settingsService)
+		clusterCredentials.SetEventBus(eventBus)
+		clusterCredentialHandler = handler.NewClusterCredentialHandler(gormDB, clusterCredentials)
+		clusterKubeconfigHandler = handler.NewClusterKubeconfigHandler(service.NewClusterKubeconfigService(gormDB, logger))
+		upgradeAssessmentHandler = handler.NewUpgradeAssessmentHandler(gormDB, service.NewUpgradeAssessmentService(gormDB, logger, jobs))
+		nodeMaintenanceHandler = handler.NewNodeMaintenanceHandler(gormDB, service.NewNodeMaintenanceService(gormDB, logger, operations))
+		certificates = service.NewCertificateService(gormDB, logger, settingsService)
+		certificates.SetEventBus(eventBus)
+		certificateHandler = handler.NewCertificateHandler(certificates)
+		clusterRBACHandler = handler.NewClusterRBACHandler(gormDB)
+		portForwards := service.NewPortForwardService(gormDB, logger, settingsService)
+		if err := portForwards.Recover(); err != nil {
+			logger.Error("failed to close interrupted port-forward sessions", zap.Error(err))
+		}
+		portForwardHandler = handler.NewPortForwardHandler(gormDB, portForwards)
+		metricsCollector = service.NewClusterMetricsCollector(gormDB, logger, cfg.Metrics.KubeStateMetrics)
+		metricsCollector.SetSettings(settingsService)
+		clusterMetricsHandler = handler.NewClusterMetricsHandler(gormDB, metricsCollector)
+		clusterFanout := service.NewClusterFanoutService(gormDB, logger, metricsCollector)
+		clusterFanoutHandler = handler.NewClusterFanoutHandler(gormDB, clusterFanout)
+		topology = service.NewTopologyService(gormDB, logger, clusterFanout)
+		topology.SetEventBus(eventBus)
+		topologyHandler = handler.NewTopologyHandler(gormDB, topology)
+		search = service.NewSearchService(gormDB, logger, clusterFanout)
+		searchHandler = handler.NewSearchHandler(search)
+		tagHandler = handler.NewTagHandler(service.NewTagService(gormDB, db.NewTagRepository(gormDB)))
+		hostBulkHandler = handler.NewHostBulkHandler(gormDB, service.NewHostBulkService(gormDB, logger, service.NewAgentCommandService(gormDB), hostLifecycle))
+		imageHandler = handler.NewImageHandler(gormDB, service.NewImageService(gormDB, logger, clusterFanout))
+		compliance = service.NewComplianceService(gormDB, logger, service.NewAgentCommandService(gormDB), settingsService)
+		complianceHandler = handler.NewComplianceHandler(gormDB, compliance)
+		backups = service.NewBackupService(gormDB, logger, settingsService, service.BackupOptions{
+			DBHost:        cfg.Database.Host,
+			DBPort:        cfg.Database.Port,
+			DBUser:        cfg.Database.User,
+			DBPassword:    cfg.Database.Password,
+			DBName:        cfg.Database.Database,
+			PgDump:        cfg.Backup.PgDump,
+			PgRestore:     cfg.Backup.PgRestore,
+			TempDir:       cfg.Backup.TempDir,
+			MigrationsDir: cfg.Health.MigrationsDir,
+			ConfigPath:    cfg.Path,
+		})
+		backupHandler = handler.NewBackupHandler(gormDB, backups)
+		veleroHandler = handler.NewVeleroHandler(gormDB, service.NewVeleroService(gormDB, logger))
+		costService = service.NewCostService(gormDB, logger, model.ClusterPricing{
+			CPUHourly:       cfg.Cost.CPUHourly,
+			MemoryGiBHourly: cfg.Cost.MemoryGiBHourly,
+			Currency:        cfg.Cost.Currency,
+		}, cfg.Metrics.CollectInterval)
+		costHandler = handler.NewCostHandler(gormDB, costService)
 		workloadHandler = handler.NewWorkloadHandler(gormDB)
+		clusterCaches = service.NewClusterCacheService(logger, service.ClusterCacheOptions{
+			Enabled:     cfg.ClusterCache.Enabled,
+			Namespaces:  cfg.ClusterCache.Namespaces,
+			MaxObjects:  cfg.ClusterCache.MaxObjects,
+			IdleTimeout: cfg.ClusterCache.IdleTimeout,
+		})
+		workloadHandler.SetClusterCache(clusterCaches)
 		podLogsWSHandler = handler.NewPodLogsWebSocketHandler(gormDB)
 		podTerminalWSHandler = handler.NewPodTerminalWebSocketHandler(gormDB)
-		helmHandler = handler.NewHelmHandler(gormDB)
-		otelHandler = handler.NewOtelHandler(gormDB)
-		prometheusHandler = handler.NewPrometheusHandler(gormDB)
+		resourceWatches = service.NewResourceWatchService(gormDB, logger)
+		resourceWatchHandler = handler.NewResourceWatchHandler(gormDB, resourceWatches)
+		helmReleases := service.NewHelmReleaseService(gormDB, logger, annotations)
+		helmReleases.SetEventBus(eventBus)
+		helmHandler = handler.NewHelmHandler(gormDB, service.NewHelmRepoService(db.NewHelmRepoRepository(gormDB)), helmReleases)
+		appCatalog = service.NewAppCatalogService(gormDB, logger, helmReleases)
+		appCatalog.SetEventBus(eventBus)
+		appCatalogHandler = handler.NewAppCatalogHandler(appCatalog)
+		gitOps = service.NewGitOpsService(gormDB, logger, service.GitOpsOptions{
+			Git:     cfg.GitOps.Git,
+			WorkDir: cfg.GitOps.WorkDir,
+		})
+		gitOps.SetEventBus(eventBus)
+		gitOpsHandler = handler.NewGitOpsHandler(gitOps)
+		pipelines := service.NewDeploymentPipelineService(gormDB, logger, helmReleases)
+		pipelines.SetEventBus(eventBus)
+		if err := pipelines.Recover(); err != nil {
+			logger.Error("failed to mark interrupted deployment pipeline runs", zap.Error(err))
+		}
+		pipelineHandler = handler.NewDeploymentPipelineHandler(pipelines)
+		otelHandler = handler.NewOtelHandler(gormDB, service.NewOtelCollectorService(gormDB, logger))
+		prometheusQueries = service.NewPrometheusQueryService(gormDB, logger, settingsService)
+		prometheusHandler = handler.NewPrometheusHandler(gormDB, prometheusQueries,
+			service.NewDataSourceService(dataSourceRepo, clusterRepo),
+			service.NewPrometheusAlertRuleService(db.NewPrometheusAlertRuleRepository(gormDB), dataSourceRepo, clusterRepo))
+		dashboardShareHandler = handler.NewDashboardShareHandler(gormDB,
+			service.NewDashboardShareService(gormDB, settingsService, service.NewDashboardRenderService(gormDB)))
 		grafanaHandler = handler.NewGrafanaHandler(gormDB)
+		grafanaHandler.SetEventBus(eventBus)
+		grafanaHandler.SetOperations(operations)
+		traceHandler = handler.NewTraceHandler(gormDB)
+		logHandler = handler.NewLogHandler(gormDB)
+		exploreHandler = handler.NewExploreHandler(gormDB)
 		aiAnalysisHandler = handler.NewAIAnalysisHandler(gormDB)
-		alertHandler = handler.NewAlertHandler(gormDB)
+		// Provider settings changed at runtime are applied to the client; enabling the
+		// LLM when no base URL was set at startup needs a restart
+		llmClient := service.NewLLMClient(settingsService.String(model.SettingLLMBaseURL),
+			settingsService.String(model.SettingLLMAPIKey), settingsService.String(model.SettingLLMModel), cfg.LLM.Timeout)
+		if llmClient != nil {
+			configureLLM := func(string, string) {
+				llmClient.Configure(settingsService.String(model.SettingLLMBaseURL),
+					settingsService.String(model.SettingLLMAPIKey), settingsService.String(model.SettingLLMModel))
+			}
+			settingsService.Watch(model.SettingLLMBaseURL, configureLLM)
+			settingsService.Watch(model.SettingLLMAPIKey, configureLLM)
+			settingsService.Watch(model.SettingLLMModel, configureLLM)
+		}
+		aiAnalysisHandler.SetLLMClient(llmClient)
+		aiAnalysisHandler.SetFeatureFlags(featureFlags)
+		aiAnalysisHandler.SetEventBus(eventBus)
+		aiAnalysisHandler.SetHostAnomalyService(hostAnomalies)
+		aiAnalysisHandler.SetLLMUsage(service.NewLLMUsageService(gormDB, settingsService, quotaService))
+		alertHandler = handler.NewAlertHandler(gormDB, service.NewAlertRuleService(db.NewAlertRuleRepository(gormDB)))
+		alertGroupService := service.NewAlertGroupService(gormDB)
+		alertGroupService.SetLLMClient(llmClient)
+		alertGroupHandler = handler.NewAlertGroupHandler(gormDB, alertGroupService)
+		maintenance := service.NewMaintenanceService(gormDB)
+		maintenanceHandler = handler.NewMaintenanceHandler(gormDB, maintenance)
+		runbookExecutor := service.NewBatchTaskExecutor(gormDB, logger)
+		runbookExecutor.SetEventBus(eventBus)
+		runbooks := service.NewRunbookService(gormDB, logger, runbookExecutor)
+		runbooks.SetEventBus(eventBus)
+		runbookHandler = handler.NewRunbookHandler(gormDB, runbooks)
+		alertEngine = service.NewAlertEngine(gormDB, logger)
+		alertEngine.SetAlertGroupService(alertGroupService)
+		alertEngine.SetMaintenanceService(maintenance)
+		alertEngine.SetEventBus(eventBus)
+		alertEngine.SetRunbookService(runbooks)
+		alertEmails := service.NewAlertEmailService(gormDB, logger, settingsService, service.NewMailer(settingsService), alertEngine)
+		alertEngine.SetAlertEmailService(alertEmails)
+		alertEmailHandler = handler.NewAlertEmailHandler(alertEmails)
+		ticketing = service.NewTicketingService(gormDB, logger, jobs, alertEngine)
+		eventBus.Handle(ticketing.HandleEvent)
+		ticketingHandler = handler.NewTicketingHandler(ticketing)
+		chatOpsHandler = handler.NewChatOpsHandler(service.NewChatOpsService(gormDB, logger, alertEngine, runbookExecutor, operations))
+		slos = service.NewSLOService(gormDB, logger, alertEngine)
+		sloHandler = handler.NewSLOHandler(slos)
+		canaries = service.NewCanaryRolloutService(gormDB, logger, slos)
+		canaries.SetEventBus(eventBus)
+		canaryHandler = handler.NewCanaryRolloutHandler(canaries)
+		synthetics = service.NewSyntheticService(gormDB, logger, settingsService, service.NewAgentCommandService(gormDB), alertEngine)
+		syntheticHandler = handler.NewSyntheticHandler(synthetics)
+		networkDiagnostics = service.NewNetworkDiagnosticService(gormDB, logger, service.NewAgentCommandService(gormDB), operations, settingsService)
+		networkDiagnosticHandler = handler.NewNetworkDiagnosticHandler(gormDB, networkDiagnostics, featureFlags)
 		auditHandler = handler.NewAuditHandler(gormDB)
+		auditChain = service.NewAuditChainService(gormDB, logger, settingsService)
+		auditHandler.SetAuditChainService(auditChain)
 		performanceHandler = handler.NewPerformanceHandler(gormDB, logger)
 		notificationHandler = handler.NewNotificationHandler(gormDB, logger)
+		notificationHandler.SetEventBus(eventBus)
+		notificationDigests = service.NewNotificationService(gormDB, logger)
+		notificationDigests.SetMailer(service.NewMailer(settingsService))
+		notificationDigests.SetEventBus(eventBus)
 		userManagementHandler = handler.NewUserManagementHandler(gormDB, logger)
 		rbacHandler = handler.NewRBACHandler(gormDB)
+		rbacHandler.SetFeatureFlags(featureFlags)
 	}
 
+	// Health checks are registered whether or not dependencies are configured, so
+	// readiness reports what is missing
+	workers := service.NewWorkerMonitor(logger)
+	healthService := service.NewHealthService(logger, workers, cfg.Health.CheckTimeout)
+	healthService.Register("database", true, service.DatabaseHealthCheck(gormDB))
+	healthService.Register("migrations", true, service.MigrationsHealthCheck(gormDB, cfg.Health.MigrationsDir))
+	if redisClient != nil {
+		healthService.Register("redis", true, func(ctx context.Context) (map[string]interface{}, error) {
+			return nil, redisClient.Ping(ctx).Err()
+		})
+	}
+	if cfg.LLM.BaseURL != "" {
+		healthService.Register("llm", false, service.HTTPReachabilityCheck(cfg.LLM.BaseURL))
+	}
+	if cfg.LDAP.URL != "" {
+		healthService.Register("ldap", false, service.LDAPReachabilityCheck(cfg.LDAP.URL))
+	}
+	healthCheckHandler := handler.NewHealthCheckHandler(gormDB, healthService)
+
+	// Hold each route to its latency SLO, raising alerts for the configured owner
+	latencyOptions := service.RouteLatencyOptions{
+		Window:      cfg.Latency.Window,
+		Default:     service.RouteLatencyThreshold{P95: cfg.Latency.P95, P99: cfg.Latency.P99},
+		Routes:      make(map[string]service.RouteLatencyThreshold, len(cfg.Latency.Routes)),
+		MinRequests: cfg.Latency.MinRequests,
+	}
+	for route, threshold := range cfg.Latency.Routes {
+		override := latencyOptions.Default
+		if threshold.P95 > 0 {
+			override.P95 = threshold.P95
+		}
+		if threshold.P99 > 0 {
+			override.P99 = threshold.P99
+		}
+		latencyOptions.Routes[route] = override
+	}
+	if cfg.Latency.AlertUserID != "" {
+		if id, err := uuid.Parse(cfg.Latency.AlertUserID); err == nil {
+			latencyOptions.AlertUserID = id
+		} else {
+			logger.Warn("invalid latency alert user, route latency breaches are only logged",
+				zap.String("alert_user_id", cfg.Latency.AlertUserID))
+		}
+	}
+	routeLatency := service.NewRouteLatencyService(gormDB, logger, alertEngine, latencyOptions)
+	healthCheckHandler.SetRouteLatency(routeLatency)
+
+	diagnostics := service.NewDiagnosticsService(gormDB, logger, service.DiagnosticsOptions{
+		Config:        cfg.Redacted(),
+		MigrationsDir: cfg.Health.MigrationsDir,
+		Health:        healthService,
+		Jobs:          jobs,
+		Commands:      service.NewAgentCommandService(gormDB),
+		ErrorLog:      errorLog,
+		Latency:       routeLatency,
+	})
+	diagnosticsHandler := handler.NewDiagnosticsHandler(gormDB, diagnostics, logger)
+
 	// Register handlers
 	mux.Handle("/api/v1/auth/register", handler.NewRegisterHandler(authService))
 	mux.Handle("/api/v1/auth/login", handler.NewLoginHandler(authService))
 	mux.Handle("/api/v1/auth/ldap-login", handler.NewLDAPLoginHandler(authService))
 	mux.Handle("/api/v1/auth/refresh", handler.NewRefreshTokenHandler(authService))
+	mux.Handle("/api/v1/auth/providers", handler.NewAuthProvidersHandler(authService))
+	oidcLoginHandler := handler.NewOIDCLoginHandler(authService, ssoService, settingsService)
+	mux.HandleFunc("/api/v1/auth/oidc/login", oidcLoginHandler.Login)
+	mux.HandleFunc("/api/v1/auth/oidc/callback", oidcLoginHandler.Callback)
+	if scimHandler != nil {
+		mux.Handle("/scim/v2/", scimHandler)
+	}
+	if accountHandler != nil {
+		mux.HandleFunc("/api/v1/auth/invitations/accept", accountHandler.AcceptInvitation)
+		mux.HandleFunc("/api/v1/auth/password-reset", accountHandler.RequestPasswordReset)
+		mux.HandleFunc("/api/v1/auth/password-reset/confirm", accountHandler.ConfirmPasswordReset)
+		mux.HandleFunc("/api/v1/auth/mfa/verify", accountHandler.VerifyMFA)
+	}
+	if dashboardShareHandler != nil {
+		mux.HandleFunc("/api/v1/public/dashboards/", dashboardShareHandler.ViewSharedDashboard)
+	}
+	if clusterConnectorHandler != nil {
+		mux.HandleFunc("/api/v1/cluster-connector/connect", clusterConnectorHandler.Connect)
+	}
 	mux.HandleFunc("/health", handler.Health)
+	mux.HandleFunc("/health/live", healthCheckHandler.Live)
+	mux.HandleFunc("/health/ready", healthCheckHandler.Ready)
+	mux.HandleFunc("/health/metrics", healthCheckHandler.Metrics)
 	mux.HandleFunc("/api/", handler.API) // Catch-all for API routes
 
 	// Register SSH WebSocket handler (before middleware)
@@ -166,12 +729,53 @@ func New(cfg *config.Config, logger *zap.Logger) *Server {
 	if clusterHandler != nil {
 		handler.RegisterClusterHandler(clusterHandler)
 	}
+	if clusterConnectorHandler != nil {
+		handler.RegisterClusterConnectorHandler(clusterConnectorHandler)
+	}
+	if clusterCredentialHandler != nil {
+		handler.RegisterClusterCredentialHandler(clusterCredentialHandler)
+	}
+	if clusterKubeconfigHandler != nil {
+		handler.RegisterClusterKubeconfigHandler(clusterKubeconfigHandler)
+	}
+	if upgradeAssessmentHandler != nil {
+		handler.RegisterUpgradeAssessmentHandler(upgradeAssessmentHandler)
+	}
+	if nodeMaintenanceHandler != nil {
+		handler.RegisterNodeMaintenanceHandler(nodeMaintenanceHandler)
+	}
+	if clusterFanoutHandler != nil {
+		handler.RegisterClusterFanoutHandler(clusterFanoutHandler)
+	}
+	if clusterRBACHandler != nil {
+		handler.RegisterClusterRBACHandler(clusterRBACHandler)
+	}
+	if portForwardHandler != nil {
+		handler.RegisterPortForwardHandler(portForwardHandler)
+	}
+	if imageHandler != nil {
+		handler.RegisterImageHandler(imageHandler)
+	}
+	if complianceHandler != nil {
+		handler.RegisterComplianceHandler(complianceHandler)
+	}
+	if backupHandler != nil {
+		handler.RegisterBackupHandler(backupHandler)
+	}
+	if veleroHandler != nil {
+		handler.RegisterVeleroHandler(veleroHandler)
+	}
 
 	// Register cluster metrics handler
 	if clusterMetricsHandler != nil {
 		handler.RegisterClusterMetricsHandler(clusterMetricsHandler)
 	}
 
+	// Register cost handler
+	if costHandler != nil {
+		handler.RegisterCostHandler(costHandler)
+	}
+
 	// Register workload handler
 	if workloadHandler != nil {
 		handler.RegisterWorkloadHandler(workloadHandler)
@@ -187,10 +791,27 @@ func New(cfg *config.Config, logger *zap.Logger) *Server {
 		handler.RegisterPodTerminalWebSocketHandler(podTerminalWSHandler)
 	}
 
+	// Register resource watch websocket handler
+	if resourceWatchHandler != nil {
+		handler.RegisterResourceWatchHandler(resourceWatchHandler)
+	}
+
 	// Register Helm handler
 	if helmHandler != nil {
 		handler.RegisterHelmHandler(helmHandler)
 	}
+	if appCatalogHandler != nil {
+		handler.RegisterAppCatalogHandler(appCatalogHandler)
+	}
+	if gitOpsHandler != nil {
+		handler.RegisterGitOpsHandler(gitOpsHandler)
+	}
+	if pipelineHandler != nil {
+		handler.RegisterDeploymentPipelineHandler(pipelineHandler)
+	}
+	if canaryHandler != nil {
+		handler.RegisterCanaryRolloutHandler(canaryHandler)
+	}
 
 	// Register OpenTelemetry handler
 	if otelHandler != nil {
@@ -206,6 +827,15 @@ func New(cfg *config.Config, logger *zap.Logger) *Server {
 	if grafanaHandler != nil {
 		handler.RegisterGrafanaHandler(grafanaHandler)
 	}
+	if traceHandler != nil {
+		handler.RegisterTraceHandler(traceHandler)
+	}
+	if logHandler != nil {
+		handler.RegisterLogHandler(logHandler)
+	}
+	if exploreHandler != nil {
+		handler.RegisterExploreHandler(exploreHandler)
+	}
 
 	// Register AI Analysis handler
 	if aiAnalysisHandler != nil {
@@ -216,6 +846,105 @@ func New(cfg *config.Config, logger *zap.Logger) *Server {
 	if alertHandler != nil {
 		handler.RegisterAlertHandler(alertHandler)
 	}
+	if alertGroupHandler != nil {
+		handler.RegisterAlertGroupHandler(alertGroupHandler)
+	}
+	if maintenanceHandler != nil {
+		handler.RegisterMaintenanceHandler(maintenanceHandler)
+	}
+	if runbookHandler != nil {
+		handler.RegisterRunbookHandler(runbookHandler)
+	}
+	if webhookHandler != nil {
+		handler.RegisterWebhookHandler(webhookHandler)
+	}
+	if ticketingHandler != nil {
+		handler.RegisterTicketingHandler(ticketingHandler)
+	}
+	if chatOpsHandler != nil {
+		handler.RegisterChatOpsHandler(chatOpsHandler)
+	}
+	if alertEmailHandler != nil {
+		handler.RegisterAlertEmailHandler(alertEmailHandler)
+	}
+	if remoteWriteHandler != nil {
+		handler.RegisterRemoteWriteHandler(remoteWriteHandler)
+	}
+	if eventStreamHandler != nil {
+		handler.RegisterEventStreamHandler(eventStreamHandler)
+	}
+	if operationHandler != nil {
+		handler.RegisterOperationHandler(operationHandler)
+	}
+	if jobQueueHandler != nil {
+		handler.RegisterJobQueueHandler(jobQueueHandler)
+	}
+	if reportHandler != nil {
+		handler.RegisterReportHandler(reportHandler)
+	}
+	if dataExportHandler != nil {
+		handler.RegisterDataExportHandler(dataExportHandler)
+	}
+	if annotationHandler != nil {
+		handler.RegisterAnnotationHandler(annotationHandler)
+	}
+	if sloHandler != nil {
+		handler.RegisterSLOHandler(sloHandler)
+	}
+	if syntheticHandler != nil {
+		handler.RegisterSyntheticHandler(syntheticHandler)
+	}
+	if certificateHandler != nil {
+		handler.RegisterCertificateHandler(certificateHandler)
+	}
+	if networkDiagnosticHandler != nil {
+		handler.RegisterNetworkDiagnosticHandler(networkDiagnosticHandler)
+	}
+	if topologyHandler != nil {
+		handler.RegisterTopologyHandler(topologyHandler)
+	}
+	if searchHandler != nil {
+		handler.RegisterSearchHandler(searchHandler)
+	}
+	if tagHandler != nil {
+		handler.RegisterTagHandler(tagHandler)
+	}
+	if hostBulkHandler != nil {
+		handler.RegisterHostBulkHandler(hostBulkHandler)
+	}
+	if hostLifecycleHandler != nil {
+		handler.RegisterHostLifecycleHandler(hostLifecycleHandler)
+	}
+	handler.RegisterHealthCheckHandler(healthCheckHandler)
+	handler.RegisterDiagnosticsHandler(diagnosticsHandler)
+	if settingsHandler != nil {
+		handler.RegisterSettingsHandler(settingsHandler)
+	}
+	if featureFlagHandler != nil {
+		handler.RegisterFeatureFlagHandler(featureFlagHandler)
+	}
+	if agentPluginHandler != nil {
+		handler.RegisterAgentPluginHandler(agentPluginHandler)
+	}
+	if directorySyncHandler != nil {
+		handler.RegisterDirectorySyncHandler(directorySyncHandler)
+	}
+	if namespaceBindingHandler != nil {
+		handler.RegisterNamespaceBindingHandler(namespaceBindingHandler)
+	}
+	if permissionTraceHandler != nil {
+		handler.RegisterPermissionTraceHandler(permissionTraceHandler)
+	}
+	if accountHandler != nil {
+		handler.RegisterAccountHandler(accountHandler)
+	}
+	if quotaService != nil {
+		handler.RegisterQuotaService(quotaService)
+		handler.RegisterQuotaHandler(handler.NewQuotaHandler(gormDB, quotaService))
+	}
+	if dashboardShareHandler != nil {
+		handler.RegisterDashboardShareHandler(dashboardShareHandler)
+	}
 
 	// Register audit handler
 	if auditHandler != nil {
@@ -242,14 +971,37 @@ func New(cfg *config.Config, logger *zap.Logger) *Server {
 		handler.RegisterRBACHandler(rbacHandler)
 	}
 
-	// Apply middleware chain
-	allowedOrigins := []string{"http://localhost:3000", "http://localhost:5173"}
+	// Websocket endpoints authenticate, limit and keep alive their connections here
+	webSockets := handler.NewWebSocketManager(jwtManager, handler.WebSocketConfig{
+		AllowedOrigins:  cfg.WebSocket.AllowedOrigins,
+		AllowOrigin:     securityPolicy.AllowedOrigin,
+		PingInterval:    cfg.WebSocket.PingInterval,
+		PongWait:        cfg.WebSocket.PongWait,
+		WriteWait:       cfg.WebSocket.WriteWait,
+		MaxMessageSize:  cfg.WebSocket.MaxMessageSize,
+		MaxConnsPerUser: cfg.WebSocket.MaxConnsPerUser,
+	})
+	handler.RegisterWebSocketManager(webSockets)
+
+	// Register batch request handler
+	handler.RegisterAPIBatchHandler(handler.NewAPIBatchHandler(logger))
+
+	// Register GraphQL read gateway
+	if gormDB != nil {
+		handler.RegisterGraphQLHandler(handler.NewGraphQLHandler(gormDB, logger))
+	}
+
 	h := middleware.Chain(
 		middleware.Recovery(logger),
 		middleware.Logger(logger),
-		middleware.RateLimit,
-		middleware.CORS(allowedOrigins),
+		middleware.Latency(routeLatency, cfg.Latency.SlowRequest, logger),
+		middleware.RateLimitWith(rateLimiter),
+		middleware.BodyLimit(bodyLimits),
+		middleware.SecurityHeaders(securityPolicy),
+		middleware.CORSWith(securityPolicy),
+		middleware.CSRF(securityPolicy),
 		middleware.Auth,
+		middleware.DatabaseAvailability(dbGuard),
 		middleware.AuditMiddleware(gormDB),
 	)(mux)
 
@@ -269,6 +1021,74 @@ func New(cfg *config.Config, logger *zap.Logger) *Server {
 		config:     cfg,
 		db:         gormDB,
 		redis:      redisClient,
+
+		health:   healthService,
+		workers:  workers,
+		settings: settingsService,
+		flags:    featureFlags,
+
+		metricsCollector: metricsCollector,
+		costService:      costService,
+
+		webhooks: webhookService,
+
+		ticketing: ticketing,
+
+		heartbeats: heartbeatService,
+
+		directorySync: directorySync,
+
+		prometheusQueries: prometheusQueries,
+
+		operations: operations,
+
+		jobs: jobs,
+
+		reports: reports,
+
+		dataExports: dataExports,
+
+		slos: slos,
+
+		synthetics: synthetics,
+
+		certificates: certificates,
+
+		networkDiagnostics: networkDiagnostics,
+
+		remoteWrite: remoteWrite,
+
+		clusterCredentials: clusterCredentials,
+
+		compliance: compliance,
+
+		backups: backups,
+
+		hostAnomalies: hostAnomalies,
+
+		topology: topology,
+
+		search: search,
+
+		notificationDigests: notificationDigests,
+
+		auditChain: auditChain,
+
+		appCatalog: appCatalog,
+
+		gitOps: gitOps,
+
+		canaries: canaries,
+
+		resourceWatches: resourceWatches,
+
+		clusterCaches: clusterCaches,
+
+		routeLatency: routeLatency,
+
+		webSockets: webSockets,
+
+		agentRPC: agentRPC,
 	}
 }
 
@@ -285,12 +1105,352 @@ func (s *Server) Start() error {
 		return fmt.Errorf("failed to listen: %w", err)
 	}
 
+	// Start reloading settings and feature flags changed on other instances
+	if s.settings != nil && s.config.Settings.RefreshInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopSettings = cancel
+		s.workers.Go(ctx, "settings", func(ctx context.Context) {
+			s.settings.Run(ctx, s.config.Settings.RefreshInterval)
+		})
+		if s.flags != nil {
+			s.workers.Go(ctx, "feature-flags", func(ctx context.Context) {
+				s.flags.Run(ctx, s.config.Settings.RefreshInterval)
+			})
+		}
+	}
+
+	// Start periodic cluster metrics collection
+	if s.metricsCollector != nil && s.config.Metrics.CollectInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopCollector = cancel
+		s.workers.Go(ctx, "cluster-metrics", func(ctx context.Context) {
+			s.metricsCollector.Run(ctx, s.config.Metrics.CollectInterval, s.config.Metrics.Retention)
+		})
+		if s.costService != nil {
+			s.workers.Go(ctx, "cost", s.costService.Run)
+		}
+	}
+
+	// Start webhook delivery retries
+	if s.webhooks != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopWebhooks = cancel
+		s.workers.Go(ctx, "webhooks", s.webhooks.Run)
+	}
+
+	// Start syncing the status of open alert tickets
+	if s.ticketing != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopTicketing = cancel
+		s.workers.Go(ctx, "ticketing", s.ticketing.Run)
+	}
+
+	// Start host heartbeat checks
+	if s.heartbeats != nil && s.config.Hosts.HeartbeatCheckInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopHeartbeats = cancel
+		s.workers.Go(ctx, "host-heartbeats", func(ctx context.Context) {
+			s.heartbeats.Run(ctx, s.config.Hosts.HeartbeatCheckInterval)
+		})
+	}
+
+	// Start scheduled directory sync, which waits for directory_sync.enabled
+	if s.directorySync != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopDirectorySync = cancel
+		s.workers.Go(ctx, "directory-sync", s.directorySync.Run)
+	}
+
+	// Start pruning of the Prometheus query history
+	if s.prometheusQueries != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopPrometheusQueries = cancel
+		s.workers.Go(ctx, "prometheus-query-history", s.prometheusQueries.Run)
+	}
+
+	// Start failing interrupted operations and pruning finished ones
+	if s.operations != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopOperations = cancel
+		s.workers.Go(ctx, "operations", s.operations.Run)
+	}
+
+	// Start the background job workers
+	if s.jobs != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopJobs = cancel
+		s.workers.Go(ctx, "jobs", s.jobs.Run)
+	}
+
+	// Start queueing scheduled reports and pruning the archive
+	if s.reports != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopReports = cancel
+		s.workers.Go(ctx, "reports", s.reports.Run)
+	}
+
+	// Start deleting expired data exports
+	if s.dataExports != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopDataExports = cancel
+		s.workers.Go(ctx, "data-exports", s.dataExports.Run)
+	}
+
+	// Start evaluating SLOs and their burn-rate alerts
+	if s.slos != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopSLOs = cancel
+		s.workers.Go(ctx, "slos", s.slos.Run)
+	}
+
+	// Start running synthetic checks from the gateway and agents
+	if s.synthetics != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopSynthetics = cancel
+		s.workers.Go(ctx, "synthetics", s.synthetics.Run)
+	}
+
+	// Start checking certificate expiry of endpoints, ingresses and kubeconfigs
+	if s.certificates != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopCertificates = cancel
+		s.workers.Go(ctx, "certificates", s.certificates.Run)
+	}
+
+	// Start pruning the network diagnostic history
+	if s.networkDiagnostics != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopNetworkDiagnostics = cancel
+		s.workers.Go(ctx, "network-diagnostics", s.networkDiagnostics.Run)
+	}
+
+	// Start pushing agent metrics to the remote_write targets
+	if s.remoteWrite != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopRemoteWrite = cancel
+		s.workers.Go(ctx, "remote-write", s.remoteWrite.Run)
+	}
+
+	// Start watching stored cluster credentials for expiry
+	if s.clusterCredentials != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopClusterCredentials = cancel
+		s.workers.Go(ctx, "cluster-credentials", s.clusterCredentials.Run)
+	}
+
+	// Start scheduled compliance scans and pruning of old reports
+	if s.compliance != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopCompliance = cancel
+		s.workers.Go(ctx, "compliance", s.compliance.Run)
+	}
+
+	// Start scheduled platform backups
+	if s.backups != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopBackups = cancel
+		s.workers.Go(ctx, "backups", s.backups.Run)
+	}
+
+	// Start evaluating host anomaly rules and pruning old host metrics
+	if s.hostAnomalies != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopHostAnomalies = cancel
+		s.workers.Go(ctx, "host-anomalies", s.hostAnomalies.Run)
+	}
+
+	// Start rebuilding the topology map and publishing its changes
+	if s.topology != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopTopology = cancel
+		s.workers.Go(ctx, "topology", s.topology.Run)
+	}
+
+	// Start indexing the pods and deployments of every cluster for search
+	if s.search != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopSearch = cancel
+		s.workers.Go(ctx, "search-index", s.search.Run)
+	}
+
+	// Start sending notification digests and email notifications
+	if s.notificationDigests != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopNotificationDigests = cancel
+		s.workers.Go(ctx, "notification-digests", s.notificationDigests.Run)
+	}
+
+	// Start sealing audit records into their hash chain and checkpointing it
+	if s.auditChain != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopAuditChain = cancel
+		s.workers.Go(ctx, "audit-chain", s.auditChain.Run)
+	}
+
+	// Start the health checks of apps installed from the catalog
+	if s.appCatalog != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopAppCatalog = cancel
+		s.workers.Go(ctx, "app-catalog", s.appCatalog.Run)
+	}
+
+	// Start checking GitOps sources against their branches and clusters
+	if s.gitOps != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopGitOps = cancel
+		s.workers.Go(ctx, "gitops", s.gitOps.Run)
+	}
+
+	// Start advancing canary and blue/green rollouts
+	if s.canaries != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopCanaries = cancel
+		s.workers.Go(ctx, "canaries", s.canaries.Run)
+	}
+
+	// Start sharing namespace informers between resource watches
+	if s.resourceWatches != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopResourceWatches = cancel
+		s.workers.Go(ctx, "resource-watches", s.resourceWatches.Run)
+	}
+
+	// Start dropping idle cluster caches
+	if s.clusterCaches != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopClusterCaches = cancel
+		s.workers.Go(ctx, "cluster-caches", s.clusterCaches.Run)
+	}
+
+	// Start checking route latency against the SLOs
+	if s.routeLatency != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopRouteLatency = cancel
+		s.workers.Go(ctx, "route-latency", s.routeLatency.Run)
+	}
+
+	// Start the gRPC agent service beside the HTTP agent endpoints
+	if s.agentRPC != nil {
+		agentListener, err := s.agentRPC.Listen()
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("failed to listen for agents: %w", err)
+		}
+		s.logger.Info("starting agent RPC service", zap.String("addr", agentListener.Addr().String()))
+		go func() {
+			if err := s.agentRPC.Serve(agentListener); err != nil {
+				s.logger.Error("agent RPC service stopped", zap.Error(err))
+			}
+		}()
+	}
+
 	return s.httpServer.Serve(listener)
 }
 
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info("shutting down API Gateway")
+	s.health.SetShuttingDown()
+
+	// Stop metrics collection
+	if s.stopCollector != nil {
+		s.stopCollector()
+	}
+	if s.stopWebhooks != nil {
+		s.stopWebhooks()
+	}
+	if s.stopTicketing != nil {
+		s.stopTicketing()
+	}
+	if s.stopHeartbeats != nil {
+		s.stopHeartbeats()
+	}
+	if s.stopSettings != nil {
+		s.stopSettings()
+	}
+	if s.stopDirectorySync != nil {
+		s.stopDirectorySync()
+	}
+	if s.stopPrometheusQueries != nil {
+		s.stopPrometheusQueries()
+	}
+	if s.stopOperations != nil {
+		s.stopOperations()
+	}
+	if s.stopJobs != nil {
+		s.stopJobs()
+	}
+	if s.stopReports != nil {
+		s.stopReports()
+	}
+	if s.stopDataExports != nil {
+		s.stopDataExports()
+	}
+	if s.stopSLOs != nil {
+		s.stopSLOs()
+	}
+	if s.stopSynthetics != nil {
+		s.stopSynthetics()
+	}
+	if s.stopCertificates != nil {
+		s.stopCertificates()
+	}
+	if s.stopNetworkDiagnostics != nil {
+		s.stopNetworkDiagnostics()
+	}
+	if s.stopRemoteWrite != nil {
+		s.stopRemoteWrite()
+	}
+	if s.stopClusterCredentials != nil {
+		s.stopClusterCredentials()
+	}
+	if s.stopCompliance != nil {
+		s.stopCompliance()
+	}
+	if s.stopBackups != nil {
+		s.stopBackups()
+	}
+	if s.stopHostAnomalies != nil {
+		s.stopHostAnomalies()
+	}
+	if s.stopTopology != nil {
+		s.stopTopology()
+	}
+	if s.stopSearch != nil {
+		s.stopSearch()
+	}
+	if s.stopNotificationDigests != nil {
+		s.stopNotificationDigests()
+	}
+	if s.stopAuditChain != nil {
+		s.stopAuditChain()
+	}
+	if s.stopAppCatalog != nil {
+		s.stopAppCatalog()
+	}
+	if s.stopGitOps != nil {
+		s.stopGitOps()
+	}
+	if s.stopCanaries != nil {
+		s.stopCanaries()
+	}
+	if s.stopResourceWatches != nil {
+		s.stopResourceWatches()
+	}
+	if s.stopClusterCaches != nil {
+		s.stopClusterCaches()
+	}
+	if s.stopRouteLatency != nil {
+		s.stopRouteLatency()
+	}
+
+	// Tell websocket clients to reconnect elsewhere
+	s.webSockets.Shutdown()
+
+	// Close agent streams so agents reconnect to another gateway
+	if s.agentRPC != nil {
+		s.agentRPC.Shutdown(ctx)
+	}
 
 	// Close Redis connection if available
 	if s.redis != nil {
@@ -0,0 +1,681 @@
+// Package service provides the account lifecycle: invitations, password resets,
+// TOTP multi-factor authentication and lockout after failed logins
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/auth"
+	"github.com/wangjialin/myops/pkg/auth/totp"
+	apperrors "github.com/wangjialin/myops/pkg/errors"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Account lifecycle limits
+const (
+	mfaChallengeTTL      = 5 * time.Minute
+	mfaChallengeAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+// Account lifecycle errors
+var (
+	ErrInvalidInvitation = apperrors.NewError("INVALID_INVITATION", "邀请无效或已过期")
+	ErrInvalidResetToken = apperrors.NewError("INVALID_RESET_TOKEN", "重置链接无效或已过期")
+	ErrEmailNotAvailable = apperrors.NewError("EMAIL_NOT_CONFIGURED", "邮件服务未配置")
+	ErrMFANotEnrolled    = apperrors.NewError("MFA_NOT_ENROLLED", "尚未开始绑定多因素认证")
+	ErrMFAAlreadyEnabled = apperrors.NewError("MFA_ALREADY_ENABLED", "多因素认证已启用")
+	ErrMFANotEnabled     = apperrors.NewError("MFA_NOT_ENABLED", "多因素认证未启用")
+)
+
+// recoveryCodeEncoding avoids padding and easily confused characters in recovery codes
+var recoveryCodeEncoding = base32.NewEncoding("ABCDEFGHJKLMNPQRSTUVWXYZ23456789").WithPadding(base32.NoPadding)
+
+// InvitationResult is a created invitation. The link is only returned when it could
+// not be emailed, so the inviter can pass it on.
+type InvitationResult struct {
+	Invitation *model.UserInvitation `json:"invitation"`
+	Emailed    bool                  `json:"emailed"`
+	InviteURL  string                `json:"inviteUrl,omitempty"`
+}
+
+// AccountService manages the account lifecycle of local users
+type AccountService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	settings *SettingsService
+	mailer   *Mailer
+}
+
+// NewAccountService creates a new account service
+func NewAccountService(db *gorm.DB, logger *zap.Logger, settings *SettingsService, mailer *Mailer) *AccountService {
+	return &AccountService{db: db, logger: logger, settings: settings, mailer: mailer}
+}
+
+// Invite creates an invitation and emails its link. A new invitation replaces any
+// pending invitation to the same address.
+func (s *AccountService) Invite(req *model.CreateInvitationRequest, invitedBy uuid.UUID) (*InvitationResult, error) {
+	email := strings.TrimSpace(strings.ToLower(req.Email))
+	if err := auth.EmailFormat(email); err != nil {
+		return nil, apperrors.Wrap("INVALID_EMAIL", err.Error(), err)
+	}
+	if req.Username != "" {
+		if err := auth.UsernameFormat(req.Username); err != nil {
+			return nil, apperrors.Wrap("INVALID_USERNAME", err.Error(), err)
+		}
+	}
+
+	var count int64
+	if err := s.db.Model(&model.User{}).Where("LOWER(email) = ?", email).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, apperrors.ErrEmailExists
+	}
+	if req.RoleID != nil {
+		if err := s.db.Select("id").First(&model.Role{}, "id = ?", *req.RoleID).Error; err != nil {
+			if stderrors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, apperrors.NewError("INVALID_ROLE", "角色不存在")
+			}
+			return nil, err
+		}
+	}
+
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	invitation := &model.UserInvitation{
+		Email:     email,
+		Username:  req.Username,
+		RoleID:    req.RoleID,
+		InvitedBy: invitedBy,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(s.settings.Duration(model.SettingAuthInvitationTTL)),
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("email = ? AND accepted_at IS NULL", email).Delete(&model.UserInvitation{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	invitation.Status = invitation.StatusAt(time.Now())
+
+	result := &InvitationResult{Invitation: invitation}
+	link := s.frontendLink("/accept-invitation", token)
+	if s.mailer.Configured() {
+		body := fmt.Sprintf("You have been invited to MyOps.\n\nCreate your account here before %s:\n%s\n",
+			invitation.ExpiresAt.Format(time.RFC1123), link)
+		if err := s.mailer.Send(email, "Your MyOps invitation", body); err != nil {
+			s.logger.Warn("failed to email invitation", zap.String("email", email), zap.Error(err))
+		} else {
+			result.Emailed = true
+		}
+	}
+	if !result.Emailed {
+		result.InviteURL = link
+	}
+	return result, nil
+}
+
+// ListInvitations returns every invitation, newest first
+func (s *AccountService) ListInvitations() ([]model.UserInvitation, error) {
+	var invitations []model.UserInvitation
+	if err := s.db.Order("created_at DESC").Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range invitations {
+		invitations[i].Status = invitations[i].StatusAt(now)
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation deletes an invitation that has not been accepted
+func (s *AccountService) RevokeInvitation(id uuid.UUID) error {
+	result := s.db.Where("id = ? AND accepted_at IS NULL", id).Delete(&model.UserInvitation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AcceptInvitation creates the invited local user and gives it the invitation's role
+func (s *AccountService) AcceptInvitation(ctx context.Context, req *model.AcceptInvitationRequest) (*model.User, error) {
+	var invitation model.UserInvitation
+	err := s.db.Where("token_hash = ?", hashSecretToken(req.Token)).First(&invitation).Error
+	if stderrors.Is(err, gorm.ErrRecordNotFound) || (err == nil && invitation.StatusAt(time.Now()) != model.InvitationStatusPending) {
+		return nil, ErrInvalidInvitation
+	} else if err != nil {
+		return nil, err
+	}
+
+	username := req.Username
+	if username == "" {
+		username = invitation.Username
+	}
+	if err := auth.UsernameFormat(username); err != nil {
+		return nil, apperrors.Wrap("INVALID_USERNAME", err.Error(), err)
+	}
+	if err := auth.PasswordStrength(req.Password); err != nil {
+		return nil, apperrors.Wrap("WEAK_PASSWORD", err.Error(), err)
+	}
+	passwordHash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &model.User{
+		ID:           uuid.New(),
+		Username:     username,
+		Email:        invitation.Email,
+		PasswordHash: passwordHash,
+		UserType:     model.UserTypeLocal,
+		DisplayName:  req.DisplayName,
+		IsActive:     true,
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return apperrors.ErrUsernameExists
+		}
+		if err := tx.Model(&model.User{}).Where("LOWER(email) = ?", invitation.Email).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return apperrors.ErrEmailExists
+		}
+
+		// Claim the invitation first so concurrent accepts create one user
+		now := time.Now()
+		result := tx.Model(&model.UserInvitation{}).Where("id = ? AND accepted_at IS NULL", invitation.ID).
+			Updates(map[string]interface{}{"accepted_at": now, "user_id": user.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidInvitation
+		}
+
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if invitation.RoleID != nil {
+			inviter := invitation.InvitedBy
+			return tx.Create(&model.UserRole{UserID: user.ID, RoleID: *invitation.RoleID, AssignedBy: &inviter}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// RequestPasswordReset emails a password reset link to the active local user with
+// the email address. It succeeds whether or not such a user exists, so callers
+// cannot probe for accounts.
+func (s *AccountService) RequestPasswordReset(email string) error {
+	if !s.mailer.Configured() {
+		return ErrEmailNotAvailable
+	}
+
+	email = strings.TrimSpace(strings.ToLower(email))
+	var user model.User
+	err := s.db.Where("LOWER(email) = ? AND user_type = ? AND is_active = ?", email, model.UserTypeLocal, true).First(&user).Error
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return err
+	}
+	reset := &model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(s.settings.Duration(model.SettingAuthPasswordResetTTL)),
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&model.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(reset).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("A password reset was requested for your MyOps account %s.\n\nSet a new password here before %s:\n%s\n\nIf you did not ask for this, ignore this email.\n",
+		user.Username, reset.ExpiresAt.Format(time.RFC1123), s.frontendLink("/reset-password", token))
+	if err := s.mailer.Send(user.Email, "Reset your MyOps password", body); err != nil {
+		s.logger.Warn("failed to email password reset", zap.String("user_id", user.ID.String()), zap.Error(err))
+	}
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token and returns the ID of the
+// user. A reset also lifts any lockout.
+func (s *AccountService) ResetPassword(req *model.ConfirmPasswordResetRequest) (uuid.UUID, error) {
+	if err := auth.PasswordStrength(req.Password); err != nil {
+		return uuid.Nil, apperrors.Wrap("WEAK_PASSWORD", err.Error(), err)
+	}
+
+	var reset model.PasswordResetToken
+	err := s.db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashSecretToken(req.Token), time.Now()).First(&reset).Error
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return uuid.Nil, ErrInvalidResetToken
+	} else if err != nil {
+		return uuid.Nil, err
+	}
+	passwordHash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.PasswordResetToken{}).Where("id = ? AND used_at IS NULL", reset.ID).Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+		result = tx.Model(&model.User{}).Where("id = ? AND user_type = ?", reset.UserID, model.UserTypeLocal).Updates(map[string]interface{}{
+			"password_hash":      passwordHash,
+			"failed_login_count": 0,
+			"locked_until":       nil,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+		return tx.Where("user_id = ? AND used_at IS NULL", reset.UserID).Delete(&model.PasswordResetToken{}).Error
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return reset.UserID, nil
+}
+
+// CheckLocked returns ErrAccountLocked while the user is locked out
+func (s *AccountService) CheckLocked(user *model.User) error {
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		return apperrors.ErrAccountLocked
+	}
+	return nil
+}
+
+// RecordFailedLogin counts a failed login and locks the user once the lockout
+// threshold is reached. It reports whether this failure locked the user.
+func (s *AccountService) RecordFailedLogin(user *model.User) (bool, error) {
+	threshold := s.settings.Int(model.SettingAuthLockoutThreshold)
+	if threshold <= 0 {
+		return false, nil
+	}
+
+	if err := s.db.Model(&model.User{}).Where("id = ?", user.ID).
+		UpdateColumn("failed_login_count", gorm.Expr("failed_login_count + 1")).Error; err != nil {
+		return false, err
+	}
+	var current model.User
+	if err := s.db.Select("id", "failed_login_count").First(&current, "id = ?", user.ID).Error; err != nil {
+		return false, err
+	}
+	if current.FailedLoginCount < threshold {
+		return false, nil
+	}
+
+	// The count starts over so a user gets the full threshold once the lock expires
+	lockedUntil := time.Now().Add(s.settings.Duration(model.SettingAuthLockoutDuration))
+	if err := s.db.Model(&model.User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+		"failed_login_count": 0,
+		"locked_until":       lockedUntil,
+	}).Error; err != nil {
+		return false, err
+	}
+	s.logger.Warn("account locked after failed logins", zap.String("user_id", user.ID.String()), zap.Time("locked_until", lockedUntil))
+	return true, nil
+}
+
+// ResetFailedLogins clears the failed login count after a successful login
+func (s *AccountService) ResetFailedLogins(user *model.User) error {
+	if user.FailedLoginCount == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	return s.db.Model(&model.User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+		"failed_login_count": 0,
+		"locked_until":       nil,
+	}).Error
+}
+
+// Unlock lifts a user's lockout
+func (s *AccountService) Unlock(userID uuid.UUID) error {
+	result := s.db.Model(&model.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"failed_login_count": 0,
+		"locked_until":       nil,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// MFAStatus returns the MFA state of a user
+func (s *AccountService) MFAStatus(userID uuid.UUID) (*model.MFAStatus, error) {
+	status := &model.MFAStatus{}
+	mfa, err := s.enrollment(userID)
+	if err != nil || mfa == nil {
+		return status, err
+	}
+	status.Enabled = mfa.Enabled
+	status.Pending = !mfa.Enabled
+	status.EnabledAt = mfa.EnabledAt
+	if err := s.db.Model(&model.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&status.RecoveryCodesRemaining).Error; err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// MFAEnabled reports whether logins of the user need a second factor
+func (s *AccountService) MFAEnabled(userID uuid.UUID) (bool, error) {
+	mfa, err := s.enrollment(userID)
+	return mfa != nil && mfa.Enabled, err
+}
+
+// EnrollMFA starts TOTP enrollment with a new secret. Enrolling again before
+// activation replaces the secret.
+func (s *AccountService) EnrollMFA(user *model.User) (*model.MFAEnrollment, error) {
+	mfa, err := s.enrollment(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa != nil && mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(&model.UserMFA{UserID: user.ID, Secret: secret}).Error; err != nil {
+		return nil, err
+	}
+	return &model.MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.URI(s.settings.String(model.SettingMFAIssuer), user.Username, secret),
+	}, nil
+}
+
+// ActivateMFA enables a pending enrollment once the user proves it with a code and
+// returns the user's recovery codes
+func (s *AccountService) ActivateMFA(userID uuid.UUID, code string) ([]string, error) {
+	mfa, err := s.enrollment(userID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil {
+		return nil, ErrMFANotEnrolled
+	}
+	if mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if !totp.Validate(mfa.Secret, code, time.Now()) {
+		return nil, apperrors.ErrInvalidMFACode
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(mfa).Updates(map[string]interface{}{"enabled": true, "enabled_at": now}).Error; err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableMFA turns off MFA for a user who proves it with a TOTP or recovery code
+func (s *AccountService) DisableMFA(userID uuid.UUID, code string) error {
+	mfa, err := s.enrollment(userID)
+	if err != nil {
+		return err
+	}
+	if mfa == nil || !mfa.Enabled {
+		return ErrMFANotEnabled
+	}
+	ok, err := s.verifyMFACode(mfa, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return apperrors.ErrInvalidMFACode
+	}
+	return s.ResetMFA(userID)
+}
+
+// ResetMFA removes a user's MFA enrollment and recovery codes without a code, for
+// administrators helping users who lost their authenticator
+func (s *AccountService) ResetMFA(userID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.MFAChallenge{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.UserMFA{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes after checking a TOTP code
+func (s *AccountService) RegenerateRecoveryCodes(userID uuid.UUID, code string) ([]string, error) {
+	mfa, err := s.enrollment(userID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil || !mfa.Enabled {
+		return nil, ErrMFANotEnabled
+	}
+	if !totp.Validate(mfa.Secret, code, time.Now()) {
+		return nil, apperrors.ErrInvalidMFACode
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// BeginMFAChallenge records a password login waiting for its second factor and
+// returns the token that completes it
+func (s *AccountService) BeginMFAChallenge(userID uuid.UUID) (string, error) {
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return "", err
+	}
+	// Expired challenges of the user are cleaned up as new ones are made
+	if err := s.db.Where("user_id = ? AND expires_at < ?", userID, time.Now()).Delete(&model.MFAChallenge{}).Error; err != nil {
+		return "", err
+	}
+	challenge := &model.MFAChallenge{UserID: userID, TokenHash: tokenHash, ExpiresAt: time.Now().Add(mfaChallengeTTL)}
+	if err := s.db.Create(challenge).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CompleteMFAChallenge checks the second factor of a login and returns the user it
+// authenticates. A challenge is used up by success or by too many wrong codes, and
+// wrong codes count towards the lockout.
+func (s *AccountService) CompleteMFAChallenge(token, code string) (*model.User, error) {
+	var challenge model.MFAChallenge
+	err := s.db.Where("token_hash = ? AND expires_at > ?", hashSecretToken(token), time.Now()).First(&challenge).Error
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apperrors.ErrInvalidMFACode
+	} else if err != nil {
+		return nil, err
+	}
+
+	var user model.User
+	if err := s.db.First(&user, "id = ?", challenge.UserID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.CheckLocked(&user); err != nil {
+		return nil, err
+	}
+	mfa, err := s.enrollment(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil || !mfa.Enabled {
+		// MFA was reset by an administrator while the challenge was pending
+		s.db.Delete(&challenge)
+		return nil, apperrors.ErrInvalidMFACode
+	}
+
+	ok, err := s.verifyMFACode(mfa, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if challenge.Attempts+1 >= mfaChallengeAttempts {
+			s.db.Delete(&challenge)
+		} else {
+			s.db.Model(&challenge).UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+		}
+		locked, err := s.RecordFailedLogin(&user)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return nil, apperrors.ErrAccountLocked
+		}
+		return nil, apperrors.ErrInvalidMFACode
+	}
+
+	if result := s.db.Delete(&challenge); result.Error != nil {
+		return nil, result.Error
+	} else if result.RowsAffected == 0 {
+		// Another request completed the challenge first
+		return nil, apperrors.ErrInvalidMFACode
+	}
+	return &user, nil
+}
+
+// enrollment returns the MFA enrollment of a user, or nil if there is none
+func (s *AccountService) enrollment(userID uuid.UUID) (*model.UserMFA, error) {
+	var mfa model.UserMFA
+	err := s.db.First(&mfa, "user_id = ?", userID).Error
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+// verifyMFACode checks a TOTP code, falling back to using up a recovery code
+func (s *AccountService) verifyMFACode(mfa *model.UserMFA, code string) (bool, error) {
+	if totp.Validate(mfa.Secret, code, time.Now()) {
+		return true, nil
+	}
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return false, nil
+	}
+	result := s.db.Model(&model.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", mfa.UserID, hashSecretToken(normalized)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// frontendLink returns the frontend URL of page with the token in its query
+func (s *AccountService) frontendLink(page, token string) string {
+	base := strings.TrimRight(s.settings.String(model.SettingAuthFrontendURL), "/")
+	return base + page + "?token=" + url.QueryEscape(token)
+}
+
+// replaceRecoveryCodes drops a user's recovery codes and returns new ones
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]model.MFARecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := recoveryCodeEncoding.EncodeToString(raw)[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		records = append(records, model.MFARecoveryCode{UserID: userID, CodeHash: hashSecretToken(code)})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode strips the separators users may type in a recovery code
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != 10 {
+		return ""
+	}
+	return code
+}
+
+// newSecretToken returns a random URL-safe token and the hash it is stored as
+func newSecretToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+	return token, hashSecretToken(token), nil
+}
+
+func hashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,199 @@
+// Package service provides business logic for the agent command channel
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/logging"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// AgentOnlineWindow is how recently an agent must have reported to receive commands
+const AgentOnlineWindow = 3 * time.Minute
+
+// agentCommandPollInterval is how often a dispatcher checks for a command result
+const agentCommandPollInterval = 500 * time.Millisecond
+
+// AgentCommandService queues commands for host agents and waits for their results.
+// Commands are stored in the database so any gateway replica can serve the agent's poll.
+type AgentCommandService struct {
+	db *gorm.DB
+}
+
+// NewAgentCommandService creates a new agent command service
+func NewAgentCommandService(db *gorm.DB) *AgentCommandService {
+	return &AgentCommandService{db: db}
+}
+
+// agentCommandWakeups wakes the command channels streaming to a host when a
+// command is queued for it on this gateway
+var agentCommandWakeups = struct {
+	sync.Mutex
+	channels map[uuid.UUID]map[chan struct{}]struct{}
+}{channels: make(map[uuid.UUID]map[chan struct{}]struct{})}
+
+// AgentAvailable reports whether the host's agent has reported recently enough to take commands
+func AgentAvailable(host *model.Host) bool {
+	return host.LastSeenAt != nil && time.Since(*host.LastSeenAt) < AgentOnlineWindow
+}
+
+// Dispatch queues a command for the host's agent and blocks until it finishes or times out
+func (s *AgentCommandService) Dispatch(ctx context.Context, hostID uuid.UUID, userID *uuid.UUID, cmdType model.AgentCommandType, args interface{}, timeout time.Duration) (*model.AgentCommand, error) {
+	cmd, err := s.Queue(ctx, hostID, userID, cmdType, args, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(agentCommandPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Only expire the command if the agent has not finished it meanwhile
+			s.db.Model(&model.AgentCommand{}).
+				Where("id = ? AND status IN ?", cmd.ID, []model.AgentCommandStatus{model.AgentCommandStatusPending, model.AgentCommandStatusDispatched}).
+				Update("status", model.AgentCommandStatusTimeout)
+			return nil, fmt.Errorf("agent did not respond within %s", timeout)
+		case <-ticker.C:
+			var current model.AgentCommand
+			if err := s.db.First(&current, "id = ?", cmd.ID).Error; err != nil {
+				return nil, fmt.Errorf("failed to load command: %w", err)
+			}
+			if current.IsFinished() {
+				return &current, nil
+			}
+		}
+	}
+}
+
+// Queue queues a command for the host's agent without waiting for its result.
+// The agent gets the command however late it next polls, with the correlation
+// ID of the request ctx belongs to.
+func (s *AgentCommandService) Queue(ctx context.Context, hostID uuid.UUID, userID *uuid.UUID, cmdType model.AgentCommandType, args interface{}, timeout time.Duration) (*model.AgentCommand, error) {
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode command arguments: %w", err)
+	}
+
+	cmd := &model.AgentCommand{
+		ID:        uuid.New(),
+		HostID:    hostID,
+		UserID:    userID,
+		Type:      cmdType,
+		Args:      string(argsJSON),
+		Status:    model.AgentCommandStatusPending,
+		Timeout:   int32(timeout.Seconds()),
+		RequestID: logging.RequestID(ctx),
+	}
+	if err := s.db.Create(cmd).Error; err != nil {
+		return nil, fmt.Errorf("failed to queue command: %w", err)
+	}
+	wakeAgentCommandChannels(hostID)
+	return cmd, nil
+}
+
+// Poll returns the pending commands for a host and marks them as dispatched
+func (s *AgentCommandService) Poll(hostID uuid.UUID) ([]model.AgentCommand, error) {
+	var commands []model.AgentCommand
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("host_id = ? AND status = ?", hostID, model.AgentCommandStatusPending).
+			Order("created_at ASC").Find(&commands).Error; err != nil {
+			return err
+		}
+		if len(commands) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(commands))
+		for i := range commands {
+			ids[i] = commands[i].ID
+		}
+		now := time.Now()
+		return tx.Model(&model.AgentCommand{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":        model.AgentCommandStatusDispatched,
+			"dispatched_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to poll commands: %w", err)
+	}
+	return commands, nil
+}
+
+// Subscribe returns a channel signalled whenever a command is queued for the host
+// on this gateway, and a function that stops the signals. Commands queued on other
+// replicas do not signal, so streams still poll now and then.
+func (s *AgentCommandService) Subscribe(hostID uuid.UUID) (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+
+	agentCommandWakeups.Lock()
+	if agentCommandWakeups.channels[hostID] == nil {
+		agentCommandWakeups.channels[hostID] = make(map[chan struct{}]struct{})
+	}
+	agentCommandWakeups.channels[hostID][wake] = struct{}{}
+	agentCommandWakeups.Unlock()
+
+	return wake, func() {
+		agentCommandWakeups.Lock()
+		defer agentCommandWakeups.Unlock()
+		delete(agentCommandWakeups.channels[hostID], wake)
+		if len(agentCommandWakeups.channels[hostID]) == 0 {
+			delete(agentCommandWakeups.channels, hostID)
+		}
+	}
+}
+
+// ConnectedHosts returns how many hosts have a command channel open to this
+// gateway
+func (s *AgentCommandService) ConnectedHosts() int {
+	agentCommandWakeups.Lock()
+	defer agentCommandWakeups.Unlock()
+	return len(agentCommandWakeups.channels)
+}
+
+func wakeAgentCommandChannels(hostID uuid.UUID) {
+	agentCommandWakeups.Lock()
+	defer agentCommandWakeups.Unlock()
+	for wake := range agentCommandWakeups.channels[hostID] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Complete records the result an agent reported for a command
+func (s *AgentCommandService) Complete(hostID, commandID uuid.UUID, result *model.AgentCommandResult) error {
+	status := model.AgentCommandStatusCompleted
+	if result.Error != "" || result.ExitCode != 0 {
+		status = model.AgentCommandStatusFailed
+	}
+
+	now := time.Now()
+	res := s.db.Model(&model.AgentCommand{}).
+		Where("id = ? AND host_id = ? AND status = ?", commandID, hostID, model.AgentCommandStatusDispatched).
+		Updates(map[string]interface{}{
+			"status":        status,
+			"exit_code":     result.ExitCode,
+			"output":        result.Output,
+			"error_message": result.Error,
+			"completed_at":  now,
+		})
+	if res.Error != nil {
+		return fmt.Errorf("failed to record command result: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,389 @@
+// Package service provides management of agent plugins and the data they report
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Agent plugin limits
+const (
+	defaultPluginInterval = 60 // seconds
+	minPluginInterval     = 10
+	maxPluginInterval     = 24 * 60 * 60
+	defaultPluginTimeout  = 10 // seconds
+	maxPluginTimeout      = 300
+	// pluginSyncTimeout bounds a plugin_sync command on the agent
+	pluginSyncTimeout = 30 * time.Second
+)
+
+var (
+	// ErrAgentPluginNotFound is returned when a plugin does not exist
+	ErrAgentPluginNotFound = errors.New("agent plugin not found")
+	// ErrAgentPluginExists is returned when a plugin name is already taken
+	ErrAgentPluginExists = errors.New("agent plugin already exists")
+	// ErrInvalidAgentPlugin is returned when a plugin definition is rejected
+	ErrInvalidAgentPlugin = errors.New("invalid agent plugin")
+)
+
+var (
+	// pluginNamePattern matches plugin names, which namespace the reported data
+	pluginNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9_-]{0,61}[a-z0-9])?$`)
+	// pluginCommandPattern matches executable names; agents only run plugins from
+	// their plugin directory, so paths are refused
+	pluginCommandPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,254}$`)
+	// pluginEnvPattern matches environment variable names
+	pluginEnvPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// AgentPluginService manages the plugins host agents run and records the data
+// they report. Agents report the hash of the plugin set they run, and a host whose
+// hash is stale is sent its current set.
+type AgentPluginService struct {
+	db       *gorm.DB
+	commands *AgentCommandService
+}
+
+// NewAgentPluginService creates a new agent plugin service
+func NewAgentPluginService(db *gorm.DB, commands *AgentCommandService) *AgentPluginService {
+	if commands == nil {
+		commands = NewAgentCommandService(db)
+	}
+	return &AgentPluginService{db: db, commands: commands}
+}
+
+// List returns all plugins by name
+func (s *AgentPluginService) List() ([]model.AgentPlugin, error) {
+	plugins := []model.AgentPlugin{}
+	if err := s.db.Order("name ASC").Find(&plugins).Error; err != nil {
+		return nil, err
+	}
+	return plugins, nil
+}
+
+// Get returns a plugin
+func (s *AgentPluginService) Get(id uuid.UUID) (*model.AgentPlugin, error) {
+	var plugin model.AgentPlugin
+	if err := s.db.Where("id = ?", id).First(&plugin).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAgentPluginNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &plugin, nil
+}
+
+// Create creates a plugin and pushes it to the agents of the hosts it runs on
+func (s *AgentPluginService) Create(req *model.CreateAgentPluginRequest, userID uuid.UUID) (*model.AgentPlugin, error) {
+	plugin := &model.AgentPlugin{
+		ID:          uuid.New(),
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Command:     strings.TrimSpace(req.Command),
+		Args:        pq.StringArray(req.Args),
+		Env:         model.LabelMap(req.Env),
+		Interval:    req.Interval,
+		Timeout:     req.Timeout,
+		HostTags:    pq.StringArray(req.HostTags),
+		Enabled:     req.Enabled == nil || *req.Enabled,
+		CreatedBy:   &userID,
+	}
+	if plugin.Interval == 0 {
+		plugin.Interval = defaultPluginInterval
+	}
+	if plugin.Timeout == 0 {
+		plugin.Timeout = defaultPluginTimeout
+	}
+	if err := validateAgentPlugin(plugin); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := s.db.Model(&model.AgentPlugin{}).Where("name = ?", plugin.Name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrAgentPluginExists
+	}
+	if err := s.db.Create(plugin).Error; err != nil {
+		return nil, err
+	}
+
+	s.push(plugin)
+	return plugin, nil
+}
+
+// Update changes a plugin and pushes the change to the agents of the hosts it ran
+// or now runs on
+func (s *AgentPluginService) Update(id uuid.UUID, req *model.UpdateAgentPluginRequest) (*model.AgentPlugin, error) {
+	plugin, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	previous := *plugin
+
+	if req.Description != nil {
+		plugin.Description = *req.Description
+	}
+	if req.Command != nil {
+		plugin.Command = strings.TrimSpace(*req.Command)
+	}
+	if req.Args != nil {
+		plugin.Args = pq.StringArray(*req.Args)
+	}
+	if req.Env != nil {
+		plugin.Env = model.LabelMap(*req.Env)
+	}
+	if req.Interval != nil {
+		plugin.Interval = *req.Interval
+	}
+	if req.Timeout != nil {
+		plugin.Timeout = *req.Timeout
+	}
+	if req.HostTags != nil {
+		plugin.HostTags = pq.StringArray(*req.HostTags)
+	}
+	if req.Enabled != nil {
+		plugin.Enabled = *req.Enabled
+	}
+	if err := validateAgentPlugin(plugin); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(plugin).Select("description", "command", "args", "env", "interval", "timeout", "host_tags", "enabled").
+		Updates(plugin).Error; err != nil {
+		return nil, err
+	}
+
+	s.push(&previous, plugin)
+	return plugin, nil
+}
+
+// Delete removes a plugin, its reported data and pushes the removal to agents
+func (s *AgentPluginService) Delete(id uuid.UUID) error {
+	plugin, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("plugin = ?", plugin.Name).Delete(&model.HostPluginData{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(plugin).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.push(plugin)
+	return nil
+}
+
+// HostData returns the latest data of each plugin reported for a host
+func (s *AgentPluginService) HostData(hostID uuid.UUID) ([]model.HostPluginData, error) {
+	data := []model.HostPluginData{}
+	if err := s.db.Where("host_id = ?", hostID).Order("plugin ASC").Find(&data).Error; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// HostPlugins returns the plugins a host should run, by name, and their hash
+func (s *AgentPluginService) HostPlugins(host *model.Host) (*model.AgentPluginSyncArgs, error) {
+	var plugins []model.AgentPlugin
+	if err := s.db.Where("enabled = ?", true).Order("name ASC").Find(&plugins).Error; err != nil {
+		return nil, err
+	}
+
+	args := &model.AgentPluginSyncArgs{Plugins: []model.AgentPluginSpec{}}
+	for i := range plugins {
+		if plugins[i].AppliesTo(host) {
+			args.Plugins = append(args.Plugins, pluginSpec(&plugins[i]))
+		}
+	}
+	args.Hash = PluginSetHash(args.Plugins)
+	return args, nil
+}
+
+// PluginSetHash returns the hash agents report for the plugin set they run. An
+// empty set hashes to "" so agents that never got plugins need no sync.
+func PluginSetHash(plugins []model.AgentPluginSpec) string {
+	if len(plugins) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(plugins)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Record stores the plugin data in a report and, with prune, drops the data of
+// plugins the agent no longer runs. Data older than what is stored, as replayed
+// from an agent's buffer, is ignored.
+func (s *AgentPluginService) Record(hostID uuid.UUID, outputs map[string]model.AgentPluginOutput, prune bool) error {
+	now := time.Now()
+	names := make([]string, 0, len(outputs))
+	rows := make([]model.HostPluginData, 0, len(outputs))
+	for name, output := range outputs {
+		if !pluginNamePattern.MatchString(name) {
+			continue
+		}
+		collectedAt := output.CollectedAt
+		if collectedAt.IsZero() || collectedAt.After(now) {
+			collectedAt = now
+		}
+		data := output.Data
+		if len(data) > 0 && !json.Valid(data) {
+			data, output.Error = nil, "plugin printed invalid JSON"
+		}
+		if len(data) == 0 {
+			data = json.RawMessage("null")
+		}
+		names = append(names, name)
+		rows = append(rows, model.HostPluginData{
+			HostID:      hostID,
+			Plugin:      name,
+			Data:        string(data),
+			Error:       output.Error,
+			CollectedAt: collectedAt,
+			UpdatedAt:   now,
+		})
+	}
+
+	if !prune && len(rows) == 0 {
+		return nil
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if prune {
+			stale := tx.Where("host_id = ?", hostID)
+			if len(names) > 0 {
+				stale = stale.Where("plugin NOT IN ?", names)
+			}
+			if err := stale.Delete(&model.HostPluginData{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "host_id"}, {Name: "plugin"}},
+			DoUpdates: clause.AssignmentColumns([]string{"data", "error", "collected_at", "updated_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Expr{SQL: "host_plugin_data.collected_at <= excluded.collected_at"},
+			}},
+		}).Create(&rows).Error
+	})
+}
+
+// Sync sends the host's agent its plugin set when the hash it reported is stale,
+// unless a sync is already on its way
+func (s *AgentPluginService) Sync(host *model.Host, reportedHash string) error {
+	args, err := s.HostPlugins(host)
+	if err != nil {
+		return err
+	}
+	if args.Hash == reportedHash {
+		return nil
+	}
+	return s.queueSync(host, args)
+}
+
+// push queues a sync for each available host one of the plugin versions runs on
+func (s *AgentPluginService) push(plugins ...*model.AgentPlugin) {
+	var hosts []model.Host
+	if err := s.db.Where("last_seen_at > ? AND status <> ?", time.Now().Add(-AgentOnlineWindow), model.HostStatusPending).
+		Find(&hosts).Error; err != nil {
+		return
+	}
+
+	for i := range hosts {
+		for _, plugin := range plugins {
+			if !plugin.AppliesTo(&hosts[i]) {
+				continue
+			}
+			if args, err := s.HostPlugins(&hosts[i]); err == nil {
+				s.queueSync(&hosts[i], args)
+			}
+			break
+		}
+	}
+}
+
+// queueSync queues a plugin_sync command unless one is pending, or dispatched
+// recently enough that its result may still come
+func (s *AgentPluginService) queueSync(host *model.Host, args *model.AgentPluginSyncArgs) error {
+	var count int64
+	err := s.db.Model(&model.AgentCommand{}).
+		Where("host_id = ? AND type = ?", host.ID, model.AgentCommandPluginSync).
+		Where("status = ? OR (status = ? AND dispatched_at > ?)",
+			model.AgentCommandStatusPending, model.AgentCommandStatusDispatched, time.Now().Add(-2*pluginSyncTimeout)).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err = s.commands.Queue(context.Background(), host.ID, nil, model.AgentCommandPluginSync, args, pluginSyncTimeout)
+	return err
+}
+
+// pluginSpec returns a plugin as the agent runs it
+func pluginSpec(plugin *model.AgentPlugin) model.AgentPluginSpec {
+	spec := model.AgentPluginSpec{
+		Name:     plugin.Name,
+		Command:  plugin.Command,
+		Args:     []string(plugin.Args),
+		Interval: plugin.Interval,
+		Timeout:  plugin.Timeout,
+	}
+	if len(plugin.Env) > 0 {
+		spec.Env = map[string]string(plugin.Env)
+	}
+	return spec
+}
+
+// validateAgentPlugin checks a plugin definition
+func validateAgentPlugin(plugin *model.AgentPlugin) error {
+	if !pluginNamePattern.MatchString(plugin.Name) {
+		return fmt.Errorf("%w: name must be lowercase letters, digits, '-' and '_', up to 63 characters", ErrInvalidAgentPlugin)
+	}
+	if !pluginCommandPattern.MatchString(plugin.Command) || strings.Contains(plugin.Command, "..") {
+		return fmt.Errorf("%w: command must be the name of an executable in the agent's plugin directory", ErrInvalidAgentPlugin)
+	}
+	if plugin.Interval < minPluginInterval || plugin.Interval > maxPluginInterval {
+		return fmt.Errorf("%w: interval must be between %d and %d seconds", ErrInvalidAgentPlugin, minPluginInterval, maxPluginInterval)
+	}
+	if plugin.Timeout < 1 || plugin.Timeout > maxPluginTimeout {
+		return fmt.Errorf("%w: timeout must be between 1 and %d seconds", ErrInvalidAgentPlugin, maxPluginTimeout)
+	}
+	if plugin.Timeout > plugin.Interval {
+		return fmt.Errorf("%w: timeout must not exceed the interval", ErrInvalidAgentPlugin)
+	}
+	names := make([]string, 0, len(plugin.Env))
+	for name := range plugin.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !pluginEnvPattern.MatchString(name) {
+			return fmt.Errorf("%w: invalid environment variable name %q", ErrInvalidAgentPlugin, name)
+		}
+	}
+	return nil
+}
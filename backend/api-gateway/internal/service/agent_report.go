@@ -0,0 +1,278 @@
+// Package service provides processing of the reports host agents send
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/config"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAgentHostNotFound is returned when an agent names a host that does not exist
+	ErrAgentHostNotFound = errors.New("host not found")
+	// ErrAgentHostRejected is returned when the reporting host has been rejected or
+	// decommissioned
+	ErrAgentHostRejected = errors.New("host has been rejected or decommissioned")
+)
+
+// AgentReport is the inventory and utilization an agent reports for its host,
+// whether it arrives over HTTP or gRPC
+type AgentReport struct {
+	Token         string // The agent token it was sent with
+	Hostname      string
+	IPAddress     string
+	OSType        string
+	OSVersion     string
+	KernelVersion string
+	Arch          string
+	CPUModel      string
+	CPUCores      int32
+	MemoryTotal   uint64 // bytes
+	Disks         []model.HostDiskUsage
+	Metrics       *model.HostMetricsReport
+
+	// CollectedAt is when a report buffered by the agent was sampled; metrics of
+	// live reports, which leave it zero, are stamped with the time received
+	CollectedAt time.Time
+
+	// Plugins holds the latest output of each plugin the agent runs, by plugin
+	// name, and PluginHash the hash of the plugin set it was last sent
+	Plugins    map[string]model.AgentPluginOutput
+	PluginHash string
+}
+
+// AgentReportService registers hosts from their agents' reports and keeps them
+// up to date and online while the agents keep reporting
+type AgentReportService struct {
+	db           *gorm.DB
+	autoApproval *config.AutoApprovalConfig
+	heartbeats   *HostHeartbeatService
+	remoteWrite  *RemoteWriteService
+	plugins      *AgentPluginService
+	anomalies    *HostAnomalyService
+	lifecycle    *HostLifecycleService
+	sharedToken  string
+}
+
+// NewAgentReportService creates a new agent report service
+func NewAgentReportService(db *gorm.DB) *AgentReportService {
+	return &AgentReportService{
+		db:           db,
+		autoApproval: config.DefaultAutoApprovalConfig(),
+	}
+}
+
+// SetHeartbeatService sets the service that brings silent hosts back online when
+// their agent reports again
+func (s *AgentReportService) SetHeartbeatService(heartbeats *HostHeartbeatService) {
+	s.heartbeats = heartbeats
+}
+
+// SetRemoteWriteService sets the service that pushes reported metrics to the
+// remote_write targets
+func (s *AgentReportService) SetRemoteWriteService(remoteWrite *RemoteWriteService) {
+	s.remoteWrite = remoteWrite
+}
+
+// SetHostAnomalyService sets the service that keeps the metric history host
+// anomaly rules are evaluated on
+func (s *AgentReportService) SetHostAnomalyService(anomalies *HostAnomalyService) {
+	s.anomalies = anomalies
+}
+
+// SetPluginService sets the service that records plugin data and keeps the
+// agents' plugin sets current
+func (s *AgentReportService) SetPluginService(plugins *AgentPluginService) {
+	s.plugins = plugins
+}
+
+// SetSharedAgentToken sets the token agents of hosts without their own token
+// authenticate with
+func (s *AgentReportService) SetSharedAgentToken(token string) {
+	s.sharedToken = token
+}
+
+// SetLifecycleService sets the service that activates provisioning hosts once
+// their agent reports
+func (s *AgentReportService) SetLifecycleService(lifecycle *HostLifecycleService) {
+	s.lifecycle = lifecycle
+}
+
+// Report records a report, matching it to the host its agent token was issued
+// by, or else to a host by IP address. Unknown hosts are created pending unless
+// the auto-approval rules let them in.
+func (s *AgentReportService) Report(report *AgentReport) (*model.Host, error) {
+	labels := reportLabels(report)
+	now := time.Now()
+
+	var host model.Host
+	err := s.reportingHost(report, &host)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		status := model.HostStatusPending
+		if s.autoApproval.ShouldAutoApprove(report.IPAddress, labels) {
+			status = model.HostStatusApproved
+		}
+
+		host = model.Host{
+			ID:         uuid.New(),
+			Hostname:   report.Hostname,
+			IPAddress:  report.IPAddress,
+			Port:       22,
+			Status:     status,
+			Lifecycle:  model.HostLifecycleProvisioning,
+			OSType:     report.OSType,
+			OSVersion:  report.OSVersion,
+			LastSeenAt: &now,
+			Labels:     labels,
+		}
+		if report.CPUCores > 0 {
+			cores := int(report.CPUCores)
+			host.CPUCores = &cores
+		}
+		if report.MemoryTotal > 0 {
+			memGB := int(report.MemoryTotal / (1024 * 1024 * 1024))
+			host.MemoryGB = &memGB
+		}
+		if err := s.db.Create(&host).Error; err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		if agentRefused(&host) {
+			return nil, ErrAgentHostRejected
+		}
+
+		// Reported labels are refreshed; labels set by users are kept
+		for key, value := range host.Labels {
+			if _, reported := labels[key]; !reported {
+				labels[key] = value
+			}
+		}
+		updates := map[string]interface{}{"labels": labels}
+		if report.Hostname != "" {
+			updates["hostname"] = report.Hostname
+		}
+		if report.OSType != "" {
+			updates["os_type"] = report.OSType
+		}
+		if report.OSVersion != "" {
+			updates["os_version"] = report.OSVersion
+		}
+		if report.CPUCores > 0 {
+			updates["cpu_cores"] = int(report.CPUCores)
+		}
+		if report.MemoryTotal > 0 {
+			updates["memory_gb"] = int(report.MemoryTotal / (1024 * 1024 * 1024))
+		}
+		host.Labels = labels
+
+		if err := s.seen(&host, updates, now); err != nil {
+			return nil, err
+		}
+	}
+
+	// Hosts let in go into service with their first report
+	if s.lifecycle != nil && host.Status != model.HostStatusPending && host.Lifecycle == model.HostLifecycleProvisioning {
+		if err := s.lifecycle.Activate(&host); err != nil {
+			return nil, err
+		}
+	}
+
+	// Buffered reports are stamped with the time they were collected
+	sampledAt := now
+	if !report.CollectedAt.IsZero() && report.CollectedAt.Before(now) {
+		sampledAt = report.CollectedAt
+	}
+
+	// Only hosts that were let in have their metrics forwarded and kept
+	if s.remoteWrite != nil && host.Status != model.HostStatusPending {
+		if report.Hostname != "" {
+			host.Hostname = report.Hostname
+		}
+		s.remoteWrite.Push(&host, report.Metrics, report.Disks, sampledAt)
+	}
+	if s.anomalies != nil && host.Status != model.HostStatusPending {
+		if err := s.anomalies.Record(host.ID, report.Metrics, report.Disks, sampledAt); err != nil {
+			return nil, err
+		}
+	}
+
+	// Pending hosts neither run plugins nor get commands until they are let in.
+	// Buffered reports carry the plugin set of their time, so only live reports
+	// drop the data of removed plugins and bring the set up to date.
+	if s.plugins != nil && host.Status != model.HostStatusPending {
+		live := report.CollectedAt.IsZero()
+		if err := s.plugins.Record(host.ID, report.Plugins, live); err != nil {
+			return nil, err
+		}
+		if live {
+			if err := s.plugins.Sync(&host, report.PluginHash); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &host, nil
+}
+
+// Heartbeat records that the host's agent, holding token, is alive without a
+// full report
+func (s *AgentReportService) Heartbeat(token string, hostID uuid.UUID) (*model.Host, error) {
+	host, err := s.AuthorizeAgent(token, hostID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.seen(host, map[string]interface{}{}, time.Now()); err != nil {
+		return nil, err
+	}
+	return host, nil
+}
+
+// seen applies updates along with the host's last-seen time and brings approved or
+// silent hosts online
+func (s *AgentReportService) seen(host *model.Host, updates map[string]interface{}, now time.Time) error {
+	updates["last_seen_at"] = now
+
+	previous, lastSeen := host.Status, host.LastSeenAt
+	silent := previous == model.HostStatusDegraded || previous == model.HostStatusOffline
+	if previous == model.HostStatusApproved || (silent && s.heartbeats == nil) {
+		updates["status"] = model.HostStatusOnline
+		updates["status_changed_at"] = now
+	}
+	if err := s.db.Model(host).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	// A report from a degraded or offline host brings it back online
+	if silent && s.heartbeats != nil {
+		host.Status, host.LastSeenAt = previous, lastSeen
+		if _, err := s.heartbeats.Transition(host, model.HostStatusOnline, now); err != nil {
+			return err
+		}
+	}
+	host.LastSeenAt = &now
+	if previous == model.HostStatusApproved || silent {
+		host.Status = model.HostStatusOnline
+	}
+	return nil
+}
+
+// reportLabels returns the labels derived from a report
+func reportLabels(report *AgentReport) model.LabelMap {
+	labels := make(model.LabelMap)
+	if report.Arch != "" {
+		labels["arch"] = report.Arch
+	}
+	if report.KernelVersion != "" {
+		labels["kernel_version"] = report.KernelVersion
+	}
+	if report.CPUModel != "" {
+		labels["cpu_model"] = report.CPUModel
+	}
+	return labels
+}
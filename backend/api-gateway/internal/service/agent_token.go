@@ -0,0 +1,143 @@
+// Package service provides the per-host tokens host agents authenticate with
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAgentTokenInvalid is returned when an agent acts for a host with a token
+	// that host was not issued
+	ErrAgentTokenInvalid = errors.New("agent token is not valid for this host")
+	// ErrAgentTokenRevoked is returned for tokens of decommissioned hosts
+	ErrAgentTokenRevoked = errors.New("agent token has been revoked")
+)
+
+// IssueAgentToken gives the host a new agent token, replacing the previous one,
+// and returns it. Only its hash is kept. Once issued a token, the host no longer
+// accepts the shared token agents otherwise authenticate with.
+func (s *AgentReportService) IssueAgentToken(ctx context.Context, hostID uuid.UUID) (*model.HostAgentTokenResponse, error) {
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.db.WithContext(ctx).Model(&model.Host{}).
+		Where("id = ? AND lifecycle NOT IN ?", hostID, []model.HostLifecycle{model.HostLifecycleDecommissioning, model.HostLifecycleRetired}).
+		Update("agent_token_hash", hash)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		var host model.Host
+		if err := s.db.WithContext(ctx).Select("id", "lifecycle").First(&host, "id = ?", hostID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAgentHostNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s hosts are not issued agent tokens", ErrInvalidHostLifecycle, host.Lifecycle)
+	}
+	return &model.HostAgentTokenResponse{HostID: hostID, Token: token}, nil
+}
+
+// AuthorizeAgent loads the host an agent acts for and checks that its token may
+// act for it: the host's own token, or the shared agent token for hosts that
+// were issued none. Rejected hosts and hosts being decommissioned are refused.
+func (s *AgentReportService) AuthorizeAgent(token string, hostID uuid.UUID) (*model.Host, error) {
+	var host model.Host
+	bound, err := s.tokenHost(token, &host)
+	if err != nil {
+		return nil, err
+	}
+	if bound {
+		if host.ID != hostID {
+			return nil, ErrAgentTokenInvalid
+		}
+	} else {
+		if !s.sharedTokenValid(token) {
+			return nil, ErrAgentTokenInvalid
+		}
+		if err := s.db.Where("id = ?", hostID).First(&host).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAgentHostNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		if host.AgentTokenHash != "" {
+			return nil, ErrAgentTokenInvalid
+		}
+	}
+	if agentRefused(&host) {
+		return nil, ErrAgentHostRejected
+	}
+	return &host, nil
+}
+
+// reportingHost loads the host a report is from: the host its token was issued
+// by, else the host with its IP address provided that host was issued no token
+// and the report carries the shared agent token
+func (s *AgentReportService) reportingHost(report *AgentReport, host *model.Host) error {
+	bound, err := s.tokenHost(report.Token, host)
+	if err != nil || bound {
+		return err
+	}
+	if !s.sharedTokenValid(report.Token) {
+		return ErrAgentTokenInvalid
+	}
+	if err := s.db.Where("ip_address = ?", report.IPAddress).First(host).Error; err != nil {
+		return err
+	}
+	if host.AgentTokenHash != "" {
+		return ErrAgentTokenInvalid
+	}
+	return nil
+}
+
+// sharedTokenValid reports whether token is the shared agent token. Without a
+// shared token configured only per-host tokens are accepted.
+func (s *AgentReportService) sharedTokenValid(token string) bool {
+	return s.sharedToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.sharedToken)) == 1
+}
+
+// tokenHost loads the host token was issued to into host, reporting whether one
+// was. Tokens revoked by decommissioning stay refused once their host is deleted.
+func (s *AgentReportService) tokenHost(token string, host *model.Host) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	hash := hashSecretToken(token)
+
+	err := s.db.Where("agent_token_hash = ?", hash).First(host).Error
+	if err == nil {
+		if host.AgentTokenRevokedAt != nil {
+			return false, ErrAgentTokenRevoked
+		}
+		return true, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	var archived int64
+	if err := s.db.Model(&model.HostArchive{}).Where("agent_token_hash = ?", hash).Count(&archived).Error; err != nil {
+		return false, err
+	}
+	if archived > 0 {
+		return false, ErrAgentTokenRevoked
+	}
+	return false, nil
+}
+
+// agentRefused reports whether the host's agent may no longer report or take
+// commands
+func agentRefused(host *model.Host) bool {
+	return host.Status == model.HostStatusRejected ||
+		host.Lifecycle == model.HostLifecycleDecommissioning ||
+		host.Lifecycle == model.HostLifecycleRetired
+}
@@ -0,0 +1,320 @@
+// Package service provides alert emails that recipients can reply to, to
+// acknowledge, resolve or silence the alert
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// alertReplyMACLength is the bytes of the reference's MAC that are kept
+	alertReplyMACLength = 10
+	// alertReplyDefaultSilence is how long `silence` without a duration silences for
+	alertReplyDefaultSilence = time.Hour
+	// alertReplyPath is the path replies arrive at, recorded in their audit records
+	alertReplyPath = "/api/v1/email/inbound"
+)
+
+// alertReplyRefPattern matches the reference alert emails carry in their subject
+// and body: the alert ID and expiry, signed, in 40 base64url characters
+var alertReplyRefPattern = regexp.MustCompile(`\[ref:([A-Za-z0-9_-]{40})\]`)
+
+// ErrEmailReplyUnauthorized is returned for inbound email without the inbound token
+var ErrEmailReplyUnauthorized = errors.New("email replies are disabled or the token is invalid")
+
+// AlertEmailService emails alerts to their owners and acts on the replies. Alert
+// emails carry a signed reference to the alert; a reply whose first line is
+// `ack`, `resolve` or `silence [duration]` acts on it as the recipient, with
+// the recipient's permissions.
+type AlertEmailService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	settings *SettingsService
+	mailer   *Mailer
+	alerts   *AlertEngine
+}
+
+// NewAlertEmailService creates a new alert email service
+func NewAlertEmailService(db *gorm.DB, logger *zap.Logger, settings *SettingsService, mailer *Mailer, alerts *AlertEngine) *AlertEmailService {
+	return &AlertEmailService{
+		db:       db,
+		logger:   logger,
+		settings: settings,
+		mailer:   mailer,
+		alerts:   alerts,
+	}
+}
+
+// repliesEnabled reports whether alert emails can be replied to
+func (s *AlertEmailService) repliesEnabled() bool {
+	return s.settings.String(model.SettingEmailReplyAddress) != "" &&
+		s.settings.String(model.SettingEmailReplySigningKey) != ""
+}
+
+// Authorize reports whether replies are enabled and token is the inbound token
+func (s *AlertEmailService) Authorize(token string) bool {
+	if s == nil || !s.repliesEnabled() {
+		return false
+	}
+	want := s.settings.String(model.SettingEmailReplyInboundToken)
+	return want != "" && subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+// Notify emails an alert to its owner and returns the address it was sent to
+func (s *AlertEmailService) Notify(alert *model.Alert) (string, error) {
+	var user model.User
+	if err := s.db.Select("id", "email").First(&user, "id = ?", alert.UserID).Error; err != nil {
+		return "", fmt.Errorf("failed to load alert owner: %w", err)
+	}
+	if user.Email == "" {
+		return "", fmt.Errorf("alert owner has no email address")
+	}
+
+	subject := fmt.Sprintf("[MyOps] [%s] %s", alert.Severity, alert.Title)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", alert.Title)
+	fmt.Fprintf(&b, "Severity: %s\n", alert.Severity)
+	fmt.Fprintf(&b, "Value: %.2f (threshold %.2f)\n", alert.Value, alert.Threshold)
+	fmt.Fprintf(&b, "Started: %s\n", alert.StartedAt.UTC().Format("2006-01-02 15:04 MST"))
+	if alert.Description != "" {
+		fmt.Fprintf(&b, "\n%s\n", alert.Description)
+	}
+	if base := strings.TrimRight(s.settings.String(model.SettingAuthFrontendURL), "/"); base != "" {
+		fmt.Fprintf(&b, "\n%s/alerts\n", base)
+	}
+
+	replyTo := ""
+	if s.repliesEnabled() {
+		ref := s.signReference(alert.ID, time.Now().Add(s.settings.Duration(model.SettingEmailReplyTokenTTL)))
+		replyTo = s.settings.String(model.SettingEmailReplyAddress)
+		subject += " [ref:" + ref + "]"
+		fmt.Fprintf(&b, "\nReply with one of these on the first line to act on the alert:\n")
+		fmt.Fprintf(&b, "  ack         acknowledge it\n")
+		fmt.Fprintf(&b, "  resolve     resolve it\n")
+		fmt.Fprintf(&b, "  silence 2h  silence it, for a duration such as 30m, 2h or 1d\n")
+		fmt.Fprintf(&b, "\n[ref:%s]\n", ref)
+	}
+
+	if err := s.mailer.SendWithReplyTo(user.Email, replyTo, subject, b.String()); err != nil {
+		return user.Email, err
+	}
+	return user.Email, nil
+}
+
+// signReference signs an alert ID and expiry into the reference of an alert email
+func (s *AlertEmailService) signReference(alertID uuid.UUID, expires time.Time) string {
+	payload := make([]byte, 20, 20+alertReplyMACLength)
+	copy(payload, alertID[:])
+	binary.BigEndian.PutUint32(payload[16:], uint32(expires.Unix()))
+	return base64.RawURLEncoding.EncodeToString(append(payload, s.referenceMAC(payload)...))
+}
+
+// verifyReference returns the alert ID of a reference that is signed and unexpired
+func (s *AlertEmailService) verifyReference(ref string, now time.Time) (uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(ref)
+	if err != nil || len(raw) != 20+alertReplyMACLength {
+		return uuid.Nil, fmt.Errorf("invalid alert reference")
+	}
+	if !hmac.Equal(raw[20:], s.referenceMAC(raw[:20])) {
+		return uuid.Nil, fmt.Errorf("invalid alert reference")
+	}
+	if now.After(time.Unix(int64(binary.BigEndian.Uint32(raw[16:20])), 0)) {
+		return uuid.Nil, fmt.Errorf("the alert reference expired")
+	}
+	var id uuid.UUID
+	copy(id[:], raw[:16])
+	return id, nil
+}
+
+func (s *AlertEmailService) referenceMAC(payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(s.settings.String(model.SettingEmailReplySigningKey)))
+	mac.Write(payload)
+	return mac.Sum(nil)[:alertReplyMACLength]
+}
+
+// HandleReply acts on a reply to an alert email. Replies that cannot be acted on
+// are ignored rather than failed, so mail providers do not retry them.
+func (s *AlertEmailService) HandleReply(email *model.InboundEmail) (*model.EmailReplyResult, error) {
+	match := alertReplyRefPattern.FindStringSubmatch(email.Subject)
+	if match == nil {
+		match = alertReplyRefPattern.FindStringSubmatch(email.Text)
+	}
+	if match == nil {
+		return &model.EmailReplyResult{Status: "ignored", Message: "no alert reference found"}, nil
+	}
+	alertID, err := s.verifyReference(match[1], time.Now())
+	if err != nil {
+		return &model.EmailReplyResult{Status: "ignored", Message: err.Error()}, nil
+	}
+
+	var alert model.Alert
+	if err := s.db.First(&alert, "id = ?", alertID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &model.EmailReplyResult{Status: "ignored", AlertID: &alertID, Message: "alert not found"}, nil
+		}
+		return nil, fmt.Errorf("failed to load alert: %w", err)
+	}
+	var user model.User
+	if err := s.db.First(&user, "id = ?", alert.UserID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load alert owner: %w", err)
+	}
+
+	command, args := parseEmailReplyCommand(email.Text)
+	if command == "" {
+		return &model.EmailReplyResult{Status: "ignored", AlertID: &alertID, Message: "no command on the first line of the reply"}, nil
+	}
+	reply := &emailReply{service: s, email: email, user: &user, alert: &alert, command: command}
+
+	// The reference is only good for the recipient it was sent to
+	if !strings.EqualFold(emailAddress(email.From), user.Email) {
+		reply.audit(http.StatusForbidden, "sender is not the recipient of the alert email")
+		return reply.result("ignored", "the reply did not come from the recipient of the alert email"), nil
+	}
+
+	return reply.run(args), nil
+}
+
+// emailReply is a command in a reply to an alert email
+type emailReply struct {
+	service *AlertEmailService
+	email   *model.InboundEmail
+	user    *model.User
+	alert   *model.Alert
+	command string
+}
+
+func (r *emailReply) run(args []string) *model.EmailReplyResult {
+	action := "silence"
+	if r.command == "resolve" {
+		action = "resolve"
+	}
+	if !model.UserHasPermission(r.service.db, r.user.ID, "alerts", action, nil, "").Allowed {
+		message := fmt.Sprintf("permission alerts.%s required", action)
+		r.audit(http.StatusForbidden, message)
+		return r.confirm("failed", message)
+	}
+	if r.alert.Status != model.AlertStatusFiring && r.alert.Status != model.AlertStatusSilenced {
+		r.audit(http.StatusConflict, ErrAlertNotActive.Error())
+		return r.confirm("failed", "the alert is no longer firing")
+	}
+
+	var err error
+	message := ""
+	switch r.command {
+	case "ack":
+		err = r.service.alerts.AcknowledgeAlert(r.alert, r.user.ID)
+		message = "acknowledged"
+	case "resolve":
+		err = r.service.alerts.ResolveAlert(r.alert)
+		message = "resolved"
+	case "silence":
+		duration := alertReplyDefaultSilence
+		if len(args) > 0 {
+			if duration, err = parseChatDuration(args[0]); err != nil {
+				r.audit(http.StatusBadRequest, err.Error())
+				return r.confirm("failed", strings.ReplaceAll(err.Error(), "`", ""))
+			}
+		}
+		until := time.Now().Add(duration)
+		err = r.service.alerts.SilenceAlert(r.alert, until)
+		message = "silenced until " + until.UTC().Format("2006-01-02 15:04 MST")
+	}
+	if err != nil {
+		r.audit(http.StatusInternalServerError, err.Error())
+		return r.confirm("failed", err.Error())
+	}
+	r.audit(http.StatusOK, "")
+	return r.confirm("applied", message)
+}
+
+// result reports the outcome of the reply
+func (r *emailReply) result(status, message string) *model.EmailReplyResult {
+	return &model.EmailReplyResult{Status: status, Action: r.command, AlertID: &r.alert.ID, Message: message}
+}
+
+// confirm emails the outcome to the recipient, without a reference so an
+// automatic reply to the confirmation is ignored, and reports it
+func (r *emailReply) confirm(status, message string) *model.EmailReplyResult {
+	subject := "[MyOps] " + r.alert.Title
+	body := fmt.Sprintf("%s: %s\n", r.alert.Title, message)
+	if status != "applied" {
+		body = fmt.Sprintf("Your %s reply to %s was not applied: %s\n", r.command, r.alert.Title, message)
+	}
+	if err := r.service.mailer.Send(r.user.Email, subject, body); err != nil {
+		r.service.logger.Warn("failed to confirm email reply", zap.String("alertId", r.alert.ID.String()), zap.Error(err))
+	}
+	return r.result(status, message)
+}
+
+// audit records the reply's command as the recipient's, with the email it came in
+func (r *emailReply) audit(status int, errMsg string) {
+	value, _ := json.Marshal(map[string]string{
+		"command": r.command,
+		"from":    r.email.From,
+		"subject": r.email.Subject,
+	})
+	entry := &model.AuditLog{
+		ID:         uuid.New(),
+		UserID:     r.user.ID,
+		Username:   r.user.Username,
+		Action:     "email_reply." + r.command,
+		Resource:   string(model.ResourceAlert),
+		ResourceID: r.alert.ID.String(),
+		Method:     http.MethodPost,
+		Path:       alertReplyPath,
+		UserAgent:  "email",
+		StatusCode: status,
+		ErrorMsg:   errMsg,
+		NewValue:   string(value),
+	}
+	if err := r.service.db.Create(entry).Error; err != nil {
+		r.service.logger.Error("failed to audit email reply", zap.Error(err))
+	}
+}
+
+// parseEmailReplyCommand reads the command on the first line of a reply. Quoted
+// lines are never commands, so a reply with nothing above the quote does nothing.
+func parseEmailReplyCommand(text string) (string, []string) {
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(strings.ToLower(line))
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.TrimRight(fields[0], ".!,") {
+		case "ack", "acknowledge", "acknowledged":
+			return "ack", nil
+		case "resolve", "resolved":
+			return "resolve", nil
+		case "silence", "silenced":
+			return "silence", fields[1:]
+		}
+		return "", nil
+	}
+	return "", nil
+}
+
+// emailAddress returns the address of a From header, or the header when it
+// does not parse
+func emailAddress(from string) string {
+	if addr, err := mail.ParseAddress(from); err == nil {
+		return addr.Address
+	}
+	return strings.TrimSpace(from)
+}
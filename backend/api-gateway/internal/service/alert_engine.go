@@ -3,6 +3,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,10 +13,19 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrAlertNotActive is returned when acknowledging or silencing an alert that
+// has resolved
+var ErrAlertNotActive = errors.New("alert is not firing")
+
 // AlertEngine evaluates alert rules and creates alerts
 type AlertEngine struct {
-	db     *gorm.DB
-	logger *zap.Logger
+	db          *gorm.DB
+	logger      *zap.Logger
+	groups      *AlertGroupService
+	maintenance *MaintenanceService
+	events      *EventBus
+	runbooks    *RunbookService
+	emails      *AlertEmailService
 }
 
 // NewAlertEngine creates a new alert engine
@@ -26,10 +36,39 @@ func NewAlertEngine(db *gorm.DB, logger *zap.Logger) *AlertEngine {
 	}
 }
 
-// EvaluateRules evaluates all enabled alert rules
+// SetAlertGroupService groups new alerts with related ones and analyzes groups as
+// they form
+func (e *AlertEngine) SetAlertGroupService(groups *AlertGroupService) {
+	e.groups = groups
+}
+
+// SetMaintenanceService suppresses alerts that match an active maintenance window
+func (e *AlertEngine) SetMaintenanceService(maintenance *MaintenanceService) {
+	e.maintenance = maintenance
+}
+
+// SetEventBus sets the bus alert fired and resolved events are published on
+func (e *AlertEngine) SetEventBus(events *EventBus) {
+	e.events = events
+}
+
+// SetRunbookService starts the automatic runbooks of a rule when its alerts fire
+func (e *AlertEngine) SetRunbookService(runbooks *RunbookService) {
+	e.runbooks = runbooks
+}
+
+// SetAlertEmailService emails the alerts of rules that notify by email
+func (e *AlertEngine) SetAlertEmailService(emails *AlertEmailService) {
+	e.emails = emails
+}
+
+// EvaluateRules evaluates all enabled alert rules. Rules other services manage,
+// such as SLO burn-rate rules, are evaluated by their owners instead.
 func (e *AlertEngine) EvaluateRules(ctx context.Context) error {
 	var rules []model.AlertRule
-	if err := e.db.Where("enabled = ? AND (silenced_until IS NULL OR silenced_until < ?)", true, time.Now()).Find(&rules).Error; err != nil {
+	if err := e.db.Where("enabled = ? AND (silenced_until IS NULL OR silenced_until < ?)", true, time.Now()).
+		Where("metric_type NOT IN ?", model.ManagedAlertMetricTypes).
+		Find(&rules).Error; err != nil {
 		return fmt.Errorf("failed to fetch alert rules: %w", err)
 	}
 
@@ -58,12 +97,27 @@ func (e *AlertEngine) EvaluateRule(ctx context.Context, rule *model.AlertRule) e
 		return fmt.Errorf("failed to get metric value: %w", err)
 	}
 
+	return e.evaluateValue(rule, value, now)
+}
+
+// EvaluateValue evaluates a rule against a value its owner computed, such as the
+// burn rate of an SLO or the failing locations of a synthetic check, firing or
+// resolving its alert like any other rule
+func (e *AlertEngine) EvaluateValue(rule *model.AlertRule, value float64) error {
+	now := time.Now()
+	rule.LastEvaluatedAt = &now
+	e.db.Model(&model.AlertRule{}).Where("id = ?", rule.ID).Update("last_evaluated_at", now)
+
+	return e.evaluateValue(rule, value, now)
+}
+
+func (e *AlertEngine) evaluateValue(rule *model.AlertRule, value float64, now time.Time) error {
 	// Check if condition is met
 	conditionMet := e.checkCondition(value, rule.Operator, rule.Threshold)
 
-	// Check for existing firing alert for this rule
+	// Check for existing firing or silenced alert for this rule
 	var existingAlert model.Alert
-	err = e.db.Where("rule_id = ? AND status = ?", rule.ID, model.AlertStatusFiring).
+	err := e.db.Where("rule_id = ? AND status IN ?", rule.ID, []model.AlertStatus{model.AlertStatusFiring, model.AlertStatusSilenced}).
 		Order("started_at DESC").
 		First(&existingAlert).Error
 
@@ -85,6 +139,9 @@ func (e *AlertEngine) EvaluateRule(ctx context.Context, rule *model.AlertRule) e
 		// Update existing alert
 		existingAlert.Value = value
 		existingAlert.UpdatedAt = now
+		if existingAlert.Status == model.AlertStatusSilenced && existingAlert.SilencedUntil != nil && !now.Before(*existingAlert.SilencedUntil) {
+			return e.unsilenceAlert(&existingAlert, rule)
+		}
 		return e.db.Save(&existingAlert).Error
 	}
 
@@ -101,6 +158,8 @@ func (e *AlertEngine) getMetricValue(ctx context.Context, rule *model.AlertRule)
 		return e.getHostMemoryMetrics(rule)
 	case "disk_usage":
 		return e.getHostDiskMetrics(rule)
+	case "host_heartbeat_age":
+		return e.getHostHeartbeatAge(rule)
 	case "cluster_cpu_usage":
 		return e.getClusterCPUMetrics(rule)
 	case "cluster_memory_usage":
@@ -109,6 +168,8 @@ func (e *AlertEngine) getMetricValue(ctx context.Context, rule *model.AlertRule)
 		return e.getNodeStatusMetrics(rule)
 	case "pod_status":
 		return e.getPodStatusMetrics(rule)
+	case model.AlertMetricSLOBurnRate, model.AlertMetricSyntheticFailures:
+		return 0, fmt.Errorf("%s rules are evaluated by the service that manages them", rule.MetricType)
 	default:
 		return 0, fmt.Errorf("unknown metric type: %s", rule.MetricType)
 	}
@@ -163,26 +224,158 @@ func (e *AlertEngine) createAlert(rule *model.AlertRule, value float64) error {
 		}
 	}
 
+	// Alerts matching an active maintenance window or of hosts out of service are
+	// recorded but stay quiet
+	suppressed := e.suppress(alert, alert.StartedAt)
+
 	if err := e.db.Create(alert).Error; err != nil {
 		return fmt.Errorf("failed to create alert: %w", err)
 	}
 
+	if suppressed {
+		e.logger.Info("alert suppressed",
+			zap.String("alertId", alert.ID.String()),
+			zap.String("ruleId", rule.ID.String()),
+			zap.String("title", alert.Title),
+		)
+		return nil
+	}
+
 	e.logger.Info("alert created",
 		zap.String("alertId", alert.ID.String()),
 		zap.String("ruleId", rule.ID.String()),
 		zap.String("title", alert.Title),
 	)
 
+	e.announce(alert, rule)
+	return nil
+}
+
+// suppress silences the alert when its host is out of service or a maintenance
+// window covers it at t
+func (e *AlertEngine) suppress(alert *model.Alert, t time.Time) bool {
+	// Alerts of hosts out of service are silenced a little at a time, for as
+	// long as the host stays out
+	if alert.HostID != nil {
+		var host model.Host
+		if err := e.db.Select("lifecycle").First(&host, "id = ?", *alert.HostID).Error; err == nil && !host.Lifecycle.InService() {
+			suppressHostAlert(alert, host.Lifecycle, t.Add(hostLifecycleSilence))
+			return true
+		}
+	}
+
+	if e.maintenance == nil {
+		return false
+	}
+	window, until, err := e.maintenance.Match(alert, t)
+	if err != nil {
+		e.logger.Error("failed to match maintenance windows",
+			zap.String("ruleId", alert.RuleID.String()),
+			zap.Error(err),
+		)
+		return false
+	}
+	if window == nil {
+		return false
+	}
+	suppressAlert(alert, window, until)
+	return true
+}
+
+// unsilenceAlert fires an alert whose silence has ended, unless its host is still
+// out of service or another maintenance occurrence covers it
+func (e *AlertEngine) unsilenceAlert(alert *model.Alert, rule *model.AlertRule) error {
+	if e.suppress(alert, alert.UpdatedAt) {
+		return e.db.Save(alert).Error
+	}
+
+	alert.Status = model.AlertStatusFiring
+	if err := e.db.Save(alert).Error; err != nil {
+		return fmt.Errorf("failed to unsilence alert: %w", err)
+	}
+
+	e.logger.Info("alert silence ended",
+		zap.String("alertId", alert.ID.String()),
+		zap.String("title", alert.Title),
+	)
+
+	e.announce(alert, rule)
+	return nil
+}
+
+// announce groups a firing alert, sends its notifications and starts its
+// rule's automatic runbooks
+func (e *AlertEngine) announce(alert *model.Alert, rule *model.AlertRule) {
+	if e.groups != nil {
+		group, formed, err := e.groups.Attach(alert)
+		if err != nil {
+			e.logger.Error("failed to group alert",
+				zap.String("alertId", alert.ID.String()),
+				zap.Error(err),
+			)
+		} else if formed {
+			e.groups.AnalyzeAsync(group.ID, group.UserID)
+		}
+	}
+
+	e.events.Publish(alert.UserID, model.EventAlertFired, alertEventAttributes(alert), alert)
+
 	// Send notifications
 	if rule.NotifyEmail || rule.NotifyWebhook {
 		go e.sendNotifications(alert, rule)
 	}
 
+	if e.runbooks != nil {
+		go e.runbooks.Trigger(alert)
+	}
+}
+
+// ResolveAlert resolves a firing or silenced alert outside rule evaluation, such
+// as when the issue opened for it is closed. An alert whose condition still holds
+// fires again as a new alert.
+func (e *AlertEngine) ResolveAlert(alert *model.Alert) error {
+	return e.resolveAlert(alert)
+}
+
+// AcknowledgeAlert records that a user is handling a firing or silenced alert.
+// The alert keeps its status; an acknowledged alert keeps its first acknowledgement.
+func (e *AlertEngine) AcknowledgeAlert(alert *model.Alert, userID uuid.UUID) error {
+	if alert.Status != model.AlertStatusFiring && alert.Status != model.AlertStatusSilenced {
+		return ErrAlertNotActive
+	}
+	if alert.AcknowledgedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	alert.AcknowledgedAt = &now
+	alert.AcknowledgedBy = &userID
+	alert.UpdatedAt = now
+	if err := e.db.Save(alert).Error; err != nil {
+		return fmt.Errorf("failed to acknowledge alert: %w", err)
+	}
+	return nil
+}
+
+// SilenceAlert silences a firing or silenced alert until the given time, when it
+// fires again if its condition still holds
+func (e *AlertEngine) SilenceAlert(alert *model.Alert, until time.Time) error {
+	if alert.Status != model.AlertStatusFiring && alert.Status != model.AlertStatusSilenced {
+		return ErrAlertNotActive
+	}
+	alert.Status = model.AlertStatusSilenced
+	alert.SilencedUntil = &until
+	alert.UpdatedAt = time.Now()
+	if err := e.db.Save(alert).Error; err != nil {
+		return fmt.Errorf("failed to silence alert: %w", err)
+	}
 	return nil
 }
 
 // resolveAlert resolves an alert
 func (e *AlertEngine) resolveAlert(alert *model.Alert) error {
+	// Silenced alerts were never announced, so their resolution is not either
+	wasFiring := alert.Status == model.AlertStatusFiring
+
 	now := time.Now()
 	alert.Status = model.AlertStatusResolved
 	alert.ResolvedAt = &now
@@ -197,9 +390,29 @@ func (e *AlertEngine) resolveAlert(alert *model.Alert) error {
 		zap.String("title", alert.Title),
 	)
 
+	if wasFiring {
+		e.events.Publish(alert.UserID, model.EventAlertResolved, alertEventAttributes(alert), alert)
+	}
+
 	return nil
 }
 
+// alertEventAttributes returns the filterable event attributes of an alert
+func alertEventAttributes(alert *model.Alert) map[string]string {
+	attrs := map[string]string{
+		"alertId":  alert.ID.String(),
+		"ruleId":   alert.RuleID.String(),
+		"severity": string(alert.Severity),
+	}
+	if alert.ClusterID != nil {
+		attrs["clusterId"] = alert.ClusterID.String()
+	}
+	if alert.HostID != nil {
+		attrs["hostId"] = alert.HostID.String()
+	}
+	return attrs
+}
+
 // sendNotifications sends notifications for an alert
 func (e *AlertEngine) sendNotifications(alert *model.Alert, rule *model.AlertRule) {
 	// Create email notification
@@ -209,11 +422,23 @@ func (e *AlertEngine) sendNotifications(alert *model.Alert, rule *model.AlertRul
 			AlertID:   alert.ID,
 			Type:      "email",
 			Status:    "pending",
-			Recipient: "", // Would be user's email
 			Content:   fmt.Sprintf("Alert: %s\n\n%s", alert.Title, alert.Description),
 		}
 		e.db.Create(notification)
-		// TODO: Actually send email
+		if e.emails != nil {
+			recipient, err := e.emails.Notify(alert)
+			notification.Recipient = recipient
+			if err != nil {
+				notification.Status = "failed"
+				notification.Error = err.Error()
+				e.logger.Warn("failed to email alert", zap.String("alertId", alert.ID.String()), zap.Error(err))
+			} else {
+				now := time.Now()
+				notification.Status = "sent"
+				notification.SentAt = &now
+			}
+			e.db.Save(notification)
+		}
 	}
 
 	// Create webhook notification
@@ -250,6 +475,22 @@ func (e *AlertEngine) getHostDiskMetrics(rule *model.AlertRule) (float64, error)
 	return 0, nil
 }
 
+// getHostHeartbeatAge returns the seconds since the target host's agent last reported
+func (e *AlertEngine) getHostHeartbeatAge(rule *model.AlertRule) (float64, error) {
+	hostID, err := uuid.Parse(rule.TargetID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid host id %q: %w", rule.TargetID, err)
+	}
+	var host model.Host
+	if err := e.db.Select("id", "last_seen_at").First(&host, "id = ?", hostID).Error; err != nil {
+		return 0, fmt.Errorf("host not found: %w", err)
+	}
+	if host.LastSeenAt == nil {
+		return 0, nil
+	}
+	return time.Since(*host.LastSeenAt).Seconds(), nil
+}
+
 func (e *AlertEngine) getClusterCPUMetrics(rule *model.AlertRule) (float64, error) {
 	// TODO: Implement cluster CPU metrics retrieval
 	return 0, nil
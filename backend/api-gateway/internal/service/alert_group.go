@@ -0,0 +1,733 @@
+// Package service provides alert grouping and root-cause analysis of alert groups
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// Alert grouping and analysis limits
+const (
+	alertGroupWindow         = 30 * time.Minute // Alerts on the same target within this window share a group
+	alertAnalysisLookback    = 15 * time.Minute // Signals are gathered from this long before the first alert
+	alertAnalysisTimeout     = 90 * time.Second
+	alertAnalysisEventLimit  = 50
+	alertAnalysisLogPods     = 3
+	alertAnalysisLogLines    = 30
+	alertAnalysisLogLimit    = 60
+	alertAnalysisMetricLimit = 60
+	alertAnalysisPromptChars = 12000
+	maxAlertSuggestions      = 6
+)
+
+// ErrAlertGroupNotFound is returned when an alert group does not exist for the user
+var ErrAlertGroupNotFound = errors.New("alert group not found")
+
+// alertAnalysisPrompt asks the LLM for a structured hypothesis
+const alertAnalysisPrompt = "You are an SRE performing root-cause analysis for a group of related alerts. " +
+	"Using only the evidence provided, state the most likely root cause. " +
+	"Reply with a single JSON object and nothing else: " +
+	`{"rootCause": "<one or two sentences>", "confidence": <0 to 1>, "suggestions": ["<next step>", ...]}. ` +
+	"Lower the confidence when the evidence is thin or contradictory."
+
+// AlertGroupService groups related alerts and analyzes the likely root cause of each group
+type AlertGroupService struct {
+	db           *gorm.DB
+	correlations *CorrelationService
+	llm          *LLMClient
+}
+
+// NewAlertGroupService creates a new alert group service
+func NewAlertGroupService(db *gorm.DB) *AlertGroupService {
+	return &AlertGroupService{db: db, correlations: NewCorrelationService(db)}
+}
+
+// SetLLMClient sets the client used for root-cause hypotheses. Without one, only the
+// built-in heuristics are used.
+func (s *AlertGroupService) SetLLMClient(client *LLMClient) {
+	s.llm = client
+}
+
+// Attach adds a firing alert to the active group for its target, creating the group
+// when there is none. formed reports whether a new group was created.
+func (s *AlertGroupService) Attach(alert *model.Alert) (group *model.AlertGroup, formed bool, err error) {
+	key := alertGroupKey(alert)
+	group = &model.AlertGroup{}
+	err = s.db.Where("user_id = ? AND group_key = ? AND status = ? AND last_alert_at >= ?",
+		alert.UserID, key, model.AlertGroupStatusActive, alert.StartedAt.Add(-alertGroupWindow)).
+		Order("last_alert_at DESC").
+		First(group).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, false, err
+	}
+
+	if err == gorm.ErrRecordNotFound {
+		ids, _ := json.Marshal([]uuid.UUID{alert.ID})
+		group = &model.AlertGroup{
+			UserID:         alert.UserID,
+			ClusterID:      alert.ClusterID,
+			GroupKey:       key,
+			Name:           s.groupName(alert),
+			Severity:       string(alert.Severity),
+			AlertCount:     1,
+			AlertIDs:       string(ids),
+			FirstAlertAt:   alert.StartedAt,
+			LastAlertAt:    alert.StartedAt,
+			Status:         model.AlertGroupStatusActive,
+			AnalysisStatus: model.AlertAnalysisPending,
+		}
+		if err := s.db.Create(group).Error; err != nil {
+			return nil, false, err
+		}
+		return group, true, nil
+	}
+
+	var ids []uuid.UUID
+	json.Unmarshal([]byte(group.AlertIDs), &ids)
+	for _, id := range ids {
+		if id == alert.ID {
+			return group, false, nil
+		}
+	}
+	ids = append(ids, alert.ID)
+	data, _ := json.Marshal(ids)
+	group.AlertIDs = string(data)
+	group.AlertCount = len(ids)
+	if alert.StartedAt.After(group.LastAlertAt) {
+		group.LastAlertAt = alert.StartedAt
+	}
+	if severityRank(string(alert.Severity)) < severityRank(group.Severity) {
+		group.Severity = string(alert.Severity)
+	}
+	if err := s.db.Save(group).Error; err != nil {
+		return nil, false, err
+	}
+	return group, false, nil
+}
+
+// AnalyzeAsync analyzes a newly formed group in the background
+func (s *AlertGroupService) AnalyzeAsync(groupID, userID uuid.UUID) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), alertAnalysisTimeout)
+		defer cancel()
+		s.Analyze(ctx, groupID, userID, true)
+	}()
+}
+
+// GetAnalysis returns the stored analysis of a group
+func (s *AlertGroupService) GetAnalysis(groupID, userID uuid.UUID) (*model.AlertGroupAnalysis, error) {
+	group, err := s.group(groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return groupAnalysis(group), nil
+}
+
+// Analyze gathers the signals around a group's alerts, forms a root-cause hypothesis and
+// stores it on the group. The LLM is asked when configured and useLLM is set; if it fails,
+// the heuristic hypothesis is kept and the failure recorded.
+func (s *AlertGroupService) Analyze(ctx context.Context, groupID, userID uuid.UUID, useLLM bool) (*model.AlertGroupAnalysis, error) {
+	group, err := s.group(groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	evidence, err := s.gatherEvidence(ctx, group)
+	if err != nil {
+		group.AnalysisStatus = model.AlertAnalysisFailed
+		group.AnalysisError = err.Error()
+		s.db.Save(group)
+		return groupAnalysis(group), nil
+	}
+
+	hypothesis := heuristicHypothesis(evidence)
+	hypothesis.source = model.AlertAnalysisSourceHeuristic
+	analysisErr := ""
+	if useLLM && s.llm != nil {
+		if llmHypothesis, err := s.askLLM(ctx, group, evidence, hypothesis); err != nil {
+			analysisErr = "LLM analysis failed, using heuristics: " + err.Error()
+		} else {
+			hypothesis = llmHypothesis
+		}
+	}
+
+	suggestions, _ := json.Marshal(hypothesis.suggestions)
+	evidenceJSON, _ := json.Marshal(evidence)
+	now := time.Now()
+	group.RootCause = hypothesis.rootCause
+	group.Confidence = hypothesis.confidence
+	group.Suggestions = string(suggestions)
+	group.Evidence = string(evidenceJSON)
+	group.AnalysisStatus = model.AlertAnalysisCompleted
+	group.AnalysisSource = hypothesis.source
+	group.AnalysisError = analysisErr
+	group.AnalyzedAt = &now
+	if err := s.db.Save(group).Error; err != nil {
+		return nil, err
+	}
+	return groupAnalysis(group), nil
+}
+
+func (s *AlertGroupService) group(groupID, userID uuid.UUID) (*model.AlertGroup, error) {
+	var group model.AlertGroup
+	if err := s.db.Where("id = ? AND user_id = ?", groupID, userID).First(&group).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrAlertGroupNotFound
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+// gatherEvidence collects the group's alerts plus the events, metrics and logs of their
+// target. Signals that cannot be gathered are recorded in Errors.
+func (s *AlertGroupService) gatherEvidence(ctx context.Context, group *model.AlertGroup) (*model.AlertGroupEvidence, error) {
+	var ids []uuid.UUID
+	if err := json.Unmarshal([]byte(group.AlertIDs), &ids); err != nil {
+		return nil, fmt.Errorf("invalid alert IDs: %w", err)
+	}
+	var alerts []model.Alert
+	if err := s.db.Where("id IN ? AND user_id = ?", ids, group.UserID).Order("started_at").Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	if len(alerts) == 0 {
+		return nil, fmt.Errorf("the group's alerts no longer exist")
+	}
+
+	evidence := &model.AlertGroupEvidence{
+		WindowStart: group.FirstAlertAt.Add(-alertAnalysisLookback).UTC(),
+		WindowEnd:   time.Now().UTC(),
+		Alerts:      []model.AlertGroupAlert{},
+		Events:      []model.AlertGroupEvent{},
+		Metrics:     []model.MetricSeries{},
+		Logs:        []model.LogEntry{},
+		Errors:      map[string]string{},
+	}
+	if evidence.WindowEnd.Sub(evidence.WindowStart) > maxCorrelationRange {
+		evidence.WindowStart = evidence.WindowEnd.Add(-maxCorrelationRange)
+	}
+	for _, alert := range alerts {
+		evidence.Alerts = append(evidence.Alerts, model.AlertGroupAlert{
+			ID:        alert.ID,
+			Title:     alert.Title,
+			Severity:  alert.Severity,
+			Status:    alert.Status,
+			Value:     alert.Value,
+			Threshold: alert.Threshold,
+			StartedAt: alert.StartedAt,
+		})
+	}
+
+	switch {
+	case group.ClusterID != nil:
+		s.clusterEvidence(ctx, group, evidence)
+	case alerts[0].HostID != nil:
+		s.hostEvidence(ctx, group, *alerts[0].HostID, evidence)
+	}
+	return evidence, nil
+}
+
+// clusterEvidence gathers warning events, stored cluster metrics and the logs of pods
+// the events point at
+func (s *AlertGroupService) clusterEvidence(ctx context.Context, group *model.AlertGroup, evidence *model.AlertGroupEvidence) {
+	s.clusterMetrics(group, evidence)
+
+	var cluster model.K8sCluster
+	if err := s.db.Where("id = ? AND user_id = ?", *group.ClusterID, group.UserID).First(&cluster).Error; err != nil {
+		evidence.Errors["events"] = "cluster not found"
+		return
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		evidence.Errors["events"] = err.Error()
+		return
+	}
+
+	events, err := client.GetWarningEvents(ctx, evidence.WindowStart, alertAnalysisEventLimit)
+	if err != nil {
+		evidence.Errors["events"] = err.Error()
+		return
+	}
+	for _, e := range events {
+		evidence.Events = append(evidence.Events, model.AlertGroupEvent{
+			Namespace: e.Namespace,
+			Kind:      e.Kind,
+			Name:      e.Name,
+			Reason:    e.Reason,
+			Message:   e.Message,
+			Count:     e.Count,
+			LastSeen:  e.LastSeen,
+		})
+	}
+
+	// Logs of the pods behind the most frequent pod events
+	var logErrs []string
+	for _, ref := range suspectPods(evidence.Events, alertAnalysisLogPods) {
+		raw, err := client.GetPodLogsSince(ctx, ref.namespace, ref.name, evidence.WindowStart, alertAnalysisLogLines)
+		if err != nil {
+			logErrs = append(logErrs, fmt.Sprintf("%s/%s: %v", ref.namespace, ref.name, err))
+			continue
+		}
+		labels := map[string]string{"namespace": ref.namespace, "pod": ref.name}
+		for _, line := range strings.Split(strings.TrimRight(raw, "\n"), "\n") {
+			if line == "" {
+				continue
+			}
+			evidence.Logs = append(evidence.Logs, model.LogEntry{
+				Line:   line,
+				Level:  LogLevel(line, labels),
+				Labels: labels,
+			})
+		}
+	}
+	if len(logErrs) > 0 {
+		evidence.Errors["logs"] = strings.Join(logErrs, "; ")
+	}
+}
+
+// clusterMetrics turns the stored cluster metric samples in the window into series
+func (s *AlertGroupService) clusterMetrics(group *model.AlertGroup, evidence *model.AlertGroupEvidence) {
+	var samples []model.ClusterMetric
+	err := s.db.Where("cluster_id = ? AND timestamp >= ? AND timestamp <= ?",
+		*group.ClusterID, evidence.WindowStart.Unix(), evidence.WindowEnd.Unix()).
+		Order("timestamp").Find(&samples).Error
+	if err != nil {
+		evidence.Errors["metrics"] = err.Error()
+		return
+	}
+	// Thin long windows to an evenly spaced subset
+	if len(samples) > alertAnalysisMetricLimit {
+		thinned := make([]model.ClusterMetric, 0, alertAnalysisMetricLimit)
+		for i := 0; i < alertAnalysisMetricLimit; i++ {
+			thinned = append(thinned, samples[i*len(samples)/alertAnalysisMetricLimit])
+		}
+		samples = thinned
+	}
+
+	metrics := []struct {
+		name  string
+		value func(m *model.ClusterMetric) float64
+	}{
+		{"cpu_usage_percent", func(m *model.ClusterMetric) float64 { return m.CPUUsagePercent }},
+		{"memory_usage_percent", func(m *model.ClusterMetric) float64 {
+			if m.MemoryTotalBytes == 0 {
+				return 0
+			}
+			return float64(m.MemoryUsageBytes) * 100 / float64(m.MemoryTotalBytes)
+		}},
+		{"not_ready_nodes", func(m *model.ClusterMetric) float64 { return float64(m.NodeCount - m.ReadyNodeCount) }},
+		{"pending_pods", func(m *model.ClusterMetric) float64 { return float64(m.PendingPodCount) }},
+		{"failed_pods", func(m *model.ClusterMetric) float64 { return float64(m.FailedPodCount) }},
+		{"crash_loop_pods", func(m *model.ClusterMetric) float64 { return float64(m.CrashLoopPodCount) }},
+	}
+	for _, metric := range metrics {
+		series := model.MetricSeries{Name: metric.name, Points: make([]model.MetricPoint, 0, len(samples))}
+		for i := range samples {
+			series.Points = append(series.Points, model.MetricPoint{
+				Timestamp: time.Unix(samples[i].Timestamp, 0).UTC(),
+				Value:     metric.value(&samples[i]),
+			})
+		}
+		if len(series.Points) > 0 {
+			evidence.Metrics = append(evidence.Metrics, series)
+		}
+	}
+}
+
+// hostEvidence correlates the host's metrics and logs over the window
+func (s *AlertGroupService) hostEvidence(ctx context.Context, group *model.AlertGroup, hostID uuid.UUID, evidence *model.AlertGroupEvidence) {
+	result, err := s.correlations.Correlate(ctx, group.UserID, &model.CorrelationRequest{
+		ResourceType: model.CorrelationResourceHost,
+		HostID:       &hostID,
+		Start:        evidence.WindowStart,
+		End:          evidence.WindowEnd,
+		LogLimit:     alertAnalysisLogLimit,
+	})
+	if err != nil {
+		evidence.Errors["metrics"] = err.Error()
+		evidence.Errors["logs"] = err.Error()
+		return
+	}
+	evidence.Metrics = result.Metrics.Series
+	evidence.Logs = result.Logs.Entries
+	if result.Metrics.Error != "" {
+		evidence.Errors["metrics"] = result.Metrics.Error
+	}
+	if result.Logs.Error != "" {
+		evidence.Errors["logs"] = result.Logs.Error
+	}
+}
+
+func (s *AlertGroupService) groupName(alert *model.Alert) string {
+	if alert.ClusterID != nil {
+		var cluster model.K8sCluster
+		if s.db.Select("name").First(&cluster, "id = ?", *alert.ClusterID).Error == nil {
+			return "Alerts on cluster " + cluster.Name
+		}
+	}
+	if alert.HostID != nil {
+		var host model.Host
+		if s.db.Select("hostname").First(&host, "id = ?", *alert.HostID).Error == nil {
+			return "Alerts on host " + host.Hostname
+		}
+	}
+	return alert.Title
+}
+
+// alertGroupKey groups alerts by user and target
+func alertGroupKey(alert *model.Alert) string {
+	target := "rule:" + alert.RuleID.String()
+	switch {
+	case alert.ClusterID != nil:
+		target = "cluster:" + alert.ClusterID.String()
+	case alert.HostID != nil:
+		target = "host:" + alert.HostID.String()
+	}
+	sum := sha256.Sum256([]byte(alert.UserID.String() + "|" + target))
+	return hex.EncodeToString(sum[:])
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case string(model.AlertSeverityCritical):
+		return 0
+	case string(model.AlertSeverityWarning):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// groupAnalysis converts the stored analysis fields of a group
+func groupAnalysis(group *model.AlertGroup) *model.AlertGroupAnalysis {
+	analysis := &model.AlertGroupAnalysis{
+		GroupID:     group.ID,
+		Status:      valueOr(group.AnalysisStatus, model.AlertAnalysisPending),
+		Source:      group.AnalysisSource,
+		RootCause:   group.RootCause,
+		Confidence:  group.Confidence,
+		Suggestions: []string{},
+		Error:       group.AnalysisError,
+		AnalyzedAt:  group.AnalyzedAt,
+	}
+	if group.Suggestions != "" {
+		json.Unmarshal([]byte(group.Suggestions), &analysis.Suggestions)
+	}
+	if group.Evidence != "" {
+		var evidence model.AlertGroupEvidence
+		if json.Unmarshal([]byte(group.Evidence), &evidence) == nil {
+			analysis.Evidence = &evidence
+		}
+	}
+	return analysis
+}
+
+// podRef names a pod referenced by warning events
+type podRef struct {
+	namespace string
+	name      string
+	count     int32
+}
+
+// suspectPods returns the pods with the most warning event occurrences
+func suspectPods(events []model.AlertGroupEvent, limit int) []podRef {
+	counts := map[string]*podRef{}
+	var refs []*podRef
+	for _, e := range events {
+		if e.Kind != "Pod" || e.Namespace == "" {
+			continue
+		}
+		key := e.Namespace + "/" + e.Name
+		ref, ok := counts[key]
+		if !ok {
+			ref = &podRef{namespace: e.Namespace, name: e.Name}
+			counts[key] = ref
+			refs = append(refs, ref)
+		}
+		ref.count += max(e.Count, 1)
+	}
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].count > refs[j].count })
+
+	out := make([]podRef, 0, limit)
+	for _, ref := range refs {
+		if len(out) == limit {
+			break
+		}
+		out = append(out, *ref)
+	}
+	return out
+}
+
+// alertHypothesis is a candidate root cause
+type alertHypothesis struct {
+	rootCause   string
+	confidence  float64
+	suggestions []string
+	source      string
+}
+
+// eventRule maps warning event reasons to a likely cause
+type eventRule struct {
+	reasons     []string
+	confidence  float64
+	cause       string // %s is replaced with the affected objects
+	suggestions []string
+}
+
+var alertEventRules = []eventRule{
+	{
+		reasons:    []string{"OOMKilling", "OOMKilled"},
+		confidence: 0.75,
+		cause:      "Containers are being killed for exceeding their memory limits (%s).",
+		suggestions: []string{
+			"Compare container memory usage with its limits and raise the limits if the workload needs more",
+			"Look for memory leaks or unbounded caches in the affected application",
+		},
+	},
+	{
+		reasons:    []string{"BackOff", "CrashLoopBackOff"},
+		confidence: 0.65,
+		cause:      "Pods are crash-looping (%s).",
+		suggestions: []string{
+			"Check the previous container logs of the crash-looping pods for the exit reason",
+			"Check whether a recent rollout changed the image, configuration or secrets",
+		},
+	},
+	{
+		reasons:    []string{"ErrImagePull", "ImagePullBackOff", "InspectFailed"},
+		confidence: 0.7,
+		cause:      "Container images cannot be pulled (%s).",
+		suggestions: []string{
+			"Verify the image name and tag exist in the registry",
+			"Check the image pull secrets and registry reachability from the nodes",
+		},
+	},
+	{
+		reasons:    []string{"FailedScheduling"},
+		confidence: 0.6,
+		cause:      "Pods cannot be scheduled, most likely from insufficient capacity or unsatisfiable constraints (%s).",
+		suggestions: []string{
+			"Check node allocatable resources against the pending pods' requests",
+			"Review node selectors, affinity rules, taints and tolerations of the pending pods",
+		},
+	},
+	{
+		reasons:    []string{"NodeNotReady", "NodeHasDiskPressure", "NodeHasMemoryPressure", "EvictionThresholdMet", "Evicted"},
+		confidence: 0.65,
+		cause:      "Nodes are unhealthy or under resource pressure (%s).",
+		suggestions: []string{
+			"Check kubelet status and node conditions on the affected nodes",
+			"Free disk or memory on the nodes, or add capacity to the cluster",
+		},
+	},
+	{
+		reasons:    []string{"FailedMount", "FailedAttachVolume"},
+		confidence: 0.6,
+		cause:      "Volumes fail to mount or attach (%s).",
+		suggestions: []string{
+			"Check the persistent volume claims and the storage provisioner",
+			"Verify referenced ConfigMaps and Secrets exist",
+		},
+	},
+	{
+		reasons:    []string{"Unhealthy"},
+		confidence: 0.5,
+		cause:      "Liveness or readiness probes are failing (%s).",
+		suggestions: []string{
+			"Check whether the application is slow to respond or its probe settings are too strict",
+			"Inspect the application's dependencies for timeouts",
+		},
+	},
+}
+
+// heuristicHypothesis picks the strongest explanation the evidence supports
+func heuristicHypothesis(evidence *model.AlertGroupEvidence) alertHypothesis {
+	var candidates []alertHypothesis
+
+	for _, rule := range alertEventRules {
+		var objects []string
+		for _, e := range evidence.Events {
+			if containsString(rule.reasons, e.Reason) && !containsString(objects, e.Name) {
+				objects = append(objects, e.Name)
+			}
+		}
+		if len(objects) == 0 {
+			continue
+		}
+		affected := strings.Join(objects[:min(len(objects), 3)], ", ")
+		if len(objects) > 3 {
+			affected += fmt.Sprintf(" and %d more", len(objects)-3)
+		}
+		candidates = append(candidates, alertHypothesis{
+			rootCause:   fmt.Sprintf(rule.cause, affected),
+			confidence:  rule.confidence,
+			suggestions: rule.suggestions,
+		})
+	}
+
+	for _, series := range evidence.Metrics {
+		peak := 0.0
+		for _, p := range series.Points {
+			peak = max(peak, p.Value)
+		}
+		name := strings.ToLower(series.Name)
+		switch {
+		case strings.Contains(name, "cpu") && strings.Contains(name, "percent") && peak >= 90:
+			candidates = append(candidates, alertHypothesis{
+				rootCause:   fmt.Sprintf("CPU is saturated (peak %.1f%%).", peak),
+				confidence:  0.5,
+				suggestions: []string{"Identify the top CPU consumers and scale out or throttle them"},
+			})
+		case strings.Contains(name, "memory") && strings.Contains(name, "percent") && peak >= 90:
+			candidates = append(candidates, alertHypothesis{
+				rootCause:   fmt.Sprintf("Memory is nearly exhausted (peak %.1f%%).", peak),
+				confidence:  0.5,
+				suggestions: []string{"Identify the top memory consumers and add capacity or limit them"},
+			})
+		case name == "not_ready_nodes" && peak > 0:
+			candidates = append(candidates, alertHypothesis{
+				rootCause:   fmt.Sprintf("Up to %.0f nodes were not ready.", peak),
+				confidence:  0.55,
+				suggestions: []string{"Check the not-ready nodes' kubelet and network connectivity"},
+			})
+		}
+	}
+
+	errorLogs := 0
+	for _, entry := range evidence.Logs {
+		if entry.Level == "error" || entry.Level == "fatal" {
+			errorLogs++
+		}
+	}
+	if errorLogs > 0 {
+		candidates = append(candidates, alertHypothesis{
+			rootCause:   fmt.Sprintf("The affected workloads logged %d errors around the alerts.", errorLogs),
+			confidence:  0.35,
+			suggestions: []string{"Review the error log lines in the evidence for the failing component"},
+		})
+	}
+
+	if len(candidates) == 0 {
+		return alertHypothesis{
+			rootCause:  fmt.Sprintf("No correlated events, metrics or logs explain the alerts; the first alert was %q.", evidence.Alerts[0].Title),
+			confidence: 0.2,
+			suggestions: []string{
+				"Check the alert rule's threshold against the metric's normal range",
+				"Configure Prometheus and log data sources so future analyses have more evidence",
+			},
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].confidence > candidates[j].confidence })
+	best := candidates[0]
+	// Further findings make the hypothesis more likely and add to the next steps
+	var suggestions []string
+	for _, c := range candidates {
+		for _, suggestion := range c.suggestions {
+			if len(suggestions) < maxAlertSuggestions && !containsString(suggestions, suggestion) {
+				suggestions = append(suggestions, suggestion)
+			}
+		}
+	}
+	best.suggestions = suggestions
+	if len(candidates) > 1 {
+		best.confidence = min(best.confidence+0.1, 0.9)
+	}
+	return best
+}
+
+// askLLM asks the LLM for a hypothesis given the evidence and the heuristic one
+func (s *AlertGroupService) askLLM(ctx context.Context, group *model.AlertGroup, evidence *model.AlertGroupEvidence, heuristic alertHypothesis) (alertHypothesis, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Alert group %q (severity %s, %d alerts) between %s and %s.\n\n",
+		group.Name, group.Severity, group.AlertCount,
+		evidence.WindowStart.Format(time.RFC3339), evidence.WindowEnd.Format(time.RFC3339))
+	b.WriteString("Alerts:\n")
+	for _, a := range evidence.Alerts {
+		fmt.Fprintf(&b, "- [%s] %s (value %.2f, threshold %.2f) at %s, %s\n",
+			a.Severity, a.Title, a.Value, a.Threshold, a.StartedAt.UTC().Format(time.RFC3339), a.Status)
+	}
+	if len(evidence.Events) > 0 {
+		b.WriteString("\nWarning events:\n")
+		for _, e := range evidence.Events {
+			fmt.Fprintf(&b, "- %s %s %s/%s (x%d): %s\n", e.LastSeen.UTC().Format(time.RFC3339),
+				e.Reason, e.Kind, e.Name, e.Count, truncateRunes(e.Message, llmContextMessageChars))
+		}
+	}
+	if len(evidence.Metrics) > 0 {
+		b.WriteString("\nMetrics (first, peak, last):\n")
+		for _, series := range evidence.Metrics {
+			if len(series.Points) == 0 {
+				continue
+			}
+			peak := series.Points[0].Value
+			for _, p := range series.Points {
+				peak = max(peak, p.Value)
+			}
+			fmt.Fprintf(&b, "- %s: %.2f, %.2f, %.2f\n", series.Name,
+				series.Points[0].Value, peak, series.Points[len(series.Points)-1].Value)
+		}
+	}
+	if len(evidence.Logs) > 0 {
+		b.WriteString("\nLogs:\n")
+		for _, entry := range evidence.Logs {
+			fmt.Fprintf(&b, "- [%s] %s\n", valueOr(entry.Level, "info"), truncateRunes(entry.Line, llmContextMessageChars))
+		}
+	}
+	for signal, msg := range evidence.Errors {
+		fmt.Fprintf(&b, "\nNote: %s could not be gathered: %s\n", signal, msg)
+	}
+	fmt.Fprintf(&b, "\nA rule-based analysis suggested (confidence %.2f): %s\n", heuristic.confidence, heuristic.rootCause)
+
+	completion, err := s.llm.Chat(ctx, "", 0.2, 800, []model.LLMChatMessage{
+		{Role: "system", Content: alertAnalysisPrompt},
+		{Role: "user", Content: truncateRunes(b.String(), alertAnalysisPromptChars)},
+	}, nil)
+	if err != nil {
+		return alertHypothesis{}, err
+	}
+
+	var reply struct {
+		RootCause   string   `json:"rootCause"`
+		Confidence  float64  `json:"confidence"`
+		Suggestions []string `json:"suggestions"`
+	}
+	content := strings.TrimSpace(completion.Content)
+	// Models often wrap JSON in a code fence despite the instructions
+	if start, end := strings.Index(content, "{"), strings.LastIndex(content, "}"); start >= 0 && end > start {
+		content = content[start : end+1]
+	}
+	if err := json.Unmarshal([]byte(content), &reply); err != nil {
+		return alertHypothesis{}, fmt.Errorf("unparseable reply: %w", err)
+	}
+	if strings.TrimSpace(reply.RootCause) == "" {
+		return alertHypothesis{}, fmt.Errorf("reply has no root cause")
+	}
+	if len(reply.Suggestions) > maxAlertSuggestions {
+		reply.Suggestions = reply.Suggestions[:maxAlertSuggestions]
+	}
+	if reply.Suggestions == nil {
+		reply.Suggestions = []string{}
+	}
+	return alertHypothesis{
+		rootCause:   reply.RootCause,
+		confidence:  min(max(reply.Confidence, 0), 1),
+		suggestions: reply.Suggestions,
+		source:      model.AlertAnalysisSourceLLM,
+	}, nil
+}
@@ -0,0 +1,111 @@
+// Package service provides management of the rules the alert engine evaluates
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// ErrAlertRuleNotFound is returned when the user has no such alert rule
+var ErrAlertRuleNotFound = errors.New("alert rule not found")
+
+// AlertRuleService manages users' host and cluster alert rules
+type AlertRuleService struct {
+	rules AlertRuleRepository
+}
+
+// NewAlertRuleService creates a new alert rule service
+func NewAlertRuleService(rules AlertRuleRepository) *AlertRuleService {
+	return &AlertRuleService{rules: rules}
+}
+
+// Create stores a new rule owned by userID
+func (s *AlertRuleService) Create(ctx context.Context, userID uuid.UUID, rule *model.AlertRule) error {
+	rule.ID = uuid.New()
+	rule.UserID = userID
+	return s.rules.Create(ctx, rule)
+}
+
+// Get returns one of the user's rules
+func (s *AlertRuleService) Get(ctx context.Context, id, userID uuid.UUID) (*model.AlertRule, error) {
+	rule, err := s.rules.FindOwned(ctx, id, userID)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, ErrAlertRuleNotFound
+	}
+	return rule, err
+}
+
+// List returns a page of the user's rules and how many match the filter
+func (s *AlertRuleService) List(ctx context.Context, filter *db.AlertRuleFilter) ([]model.AlertRule, int64, error) {
+	return s.rules.List(ctx, filter)
+}
+
+// Update copies the non-zero fields of req onto one of the user's rules. The
+// notification switches are always copied since false cannot be told from unset.
+func (s *AlertRuleService) Update(ctx context.Context, id, userID uuid.UUID, req *model.AlertRule) (*model.AlertRule, error) {
+	rule, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []string{"NotifyEmail", "NotifyWebhook"}
+	if req.Name != "" {
+		rule.Name = req.Name
+		fields = append(fields, "Name")
+	}
+	if req.Description != "" {
+		rule.Description = req.Description
+		fields = append(fields, "Description")
+	}
+	if req.TargetType != "" {
+		rule.TargetType = req.TargetType
+		fields = append(fields, "TargetType")
+	}
+	if req.TargetID != "" {
+		rule.TargetID = req.TargetID
+		fields = append(fields, "TargetID")
+	}
+	if req.MetricType != "" {
+		rule.MetricType = req.MetricType
+		fields = append(fields, "MetricType")
+	}
+	if req.Operator != "" {
+		rule.Operator = req.Operator
+		fields = append(fields, "Operator")
+	}
+	if req.Threshold != 0 {
+		rule.Threshold = req.Threshold
+		fields = append(fields, "Threshold")
+	}
+	if req.Duration != 0 {
+		rule.Duration = req.Duration
+		fields = append(fields, "Duration")
+	}
+	if req.Severity != "" {
+		rule.Severity = req.Severity
+		fields = append(fields, "Severity")
+	}
+	if req.WebhookURL != "" {
+		rule.WebhookURL = req.WebhookURL
+		fields = append(fields, "WebhookURL")
+	}
+	rule.NotifyEmail = req.NotifyEmail
+	rule.NotifyWebhook = req.NotifyWebhook
+
+	if err := s.rules.Update(ctx, rule, fields...); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// Delete removes one of the user's rules with the alerts it raised
+func (s *AlertRuleService) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	if _, err := s.Get(ctx, id, userID); err != nil {
+		return err
+	}
+	return s.rules.Delete(ctx, id)
+}
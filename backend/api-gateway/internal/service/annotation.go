@@ -0,0 +1,452 @@
+// Package service provides dashboard annotations: events recorded through the
+// API or annotation webhooks, shown on the graphs of the dashboards they apply to
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// Annotation limits
+const (
+	maxAnnotationTags         = 20
+	maxDashboardAnnotations   = 500 // Per render
+	maxMaintenanceOccurrences = 100 // Of one recurring window per render
+)
+
+var (
+	// ErrInvalidAnnotation is returned for annotations and annotation webhooks that cannot be saved
+	ErrInvalidAnnotation = errors.New("invalid annotation")
+	// ErrAnnotationNotFound is returned when the annotation does not exist or belongs to another user
+	ErrAnnotationNotFound = errors.New("annotation not found")
+	// ErrAnnotationWebhookNotFound is returned when the annotation webhook does not exist or belongs to another user
+	ErrAnnotationWebhookNotFound = errors.New("annotation webhook not found")
+	// ErrAnnotationUnauthorized is returned when an inbound request presents a wrong token
+	ErrAnnotationUnauthorized = errors.New("invalid annotation webhook token")
+)
+
+// AnnotationService records annotations and finds those of a dashboard
+type AnnotationService struct {
+	db *gorm.DB
+}
+
+// NewAnnotationService creates a new annotation service
+func NewAnnotationService(db *gorm.DB) *AnnotationService {
+	return &AnnotationService{db: db}
+}
+
+// Create validates and records an annotation of the user
+func (s *AnnotationService) Create(userID uuid.UUID, createdBy string, req *model.CreateAnnotationRequest) (*model.Annotation, error) {
+	annotation := &model.Annotation{
+		UserID:      userID,
+		DashboardID: req.DashboardID,
+		ClusterID:   req.ClusterID,
+		Kind:        req.Kind,
+		Title:       strings.TrimSpace(req.Title),
+		Text:        req.Text,
+		Tags:        pq.StringArray(req.Tags),
+		EndsAt:      req.EndsAt,
+		Source:      model.AnnotationSourceManual,
+		CreatedBy:   createdBy,
+	}
+	if req.StartsAt != nil {
+		annotation.StartsAt = *req.StartsAt
+	}
+	if err := s.Record(annotation); err != nil {
+		return nil, err
+	}
+	return annotation, nil
+}
+
+// Record validates and stores an annotation built by the platform, such as one
+// of a deployment. StartsAt defaults to now and Kind to custom.
+func (s *AnnotationService) Record(annotation *model.Annotation) error {
+	if annotation.StartsAt.IsZero() {
+		annotation.StartsAt = time.Now().UTC()
+	}
+	if annotation.Kind == "" {
+		annotation.Kind = model.AnnotationCustom
+	}
+	if annotation.Tags == nil {
+		annotation.Tags = pq.StringArray{}
+	}
+	if err := s.validate(annotation.UserID, annotation.Kind, annotation.Title, annotation.Tags, annotation.DashboardID, annotation.ClusterID); err != nil {
+		return err
+	}
+	if annotation.EndsAt != nil && annotation.EndsAt.Before(annotation.StartsAt) {
+		return fmt.Errorf("%w: endsAt must not be before startsAt", ErrInvalidAnnotation)
+	}
+	return s.db.Create(annotation).Error
+}
+
+// validate checks the fields annotations and webhooks share, and that the
+// dashboard or cluster they are scoped to is the user's
+func (s *AnnotationService) validate(userID uuid.UUID, kind model.AnnotationKind, title string, tags []string, dashboardID, clusterID *uuid.UUID) error {
+	if !kind.IsValid() {
+		return fmt.Errorf("%w: kind must be deployment, incident, maintenance or custom", ErrInvalidAnnotation)
+	}
+	if title == "" || len(title) > 255 {
+		return fmt.Errorf("%w: title is required and at most 255 characters", ErrInvalidAnnotation)
+	}
+	if len(tags) > maxAnnotationTags {
+		return fmt.Errorf("%w: at most %d tags", ErrInvalidAnnotation, maxAnnotationTags)
+	}
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("%w: tags must not be empty", ErrInvalidAnnotation)
+		}
+	}
+	if dashboardID != nil && clusterID != nil {
+		return fmt.Errorf("%w: set dashboardId or clusterId, not both", ErrInvalidAnnotation)
+	}
+	if dashboardID != nil {
+		var count int64
+		s.db.Model(&model.PrometheusDashboard{}).Where("id = ? AND user_id = ?", *dashboardID, userID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("%w: dashboard not found", ErrInvalidAnnotation)
+		}
+	}
+	if clusterID != nil {
+		var count int64
+		s.db.Model(&model.K8sCluster{}).Where("id = ? AND user_id = ?", *clusterID, userID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("%w: cluster not found", ErrInvalidAnnotation)
+		}
+	}
+	return nil
+}
+
+// List returns the user's annotations matching the filter, newest first
+func (s *AnnotationService) List(userID uuid.UUID, filter model.AnnotationFilter, limit, offset int) ([]model.Annotation, int64, error) {
+	query := s.db.Model(&model.Annotation{}).Where("user_id = ?", userID)
+	if filter.From != nil {
+		query = query.Where("COALESCE(ends_at, starts_at) >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("starts_at <= ?", *filter.To)
+	}
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+	if len(filter.Tags) > 0 {
+		query = query.Where("tags && ?", pq.StringArray(filter.Tags))
+	}
+	if filter.DashboardID != nil {
+		query = query.Where("dashboard_id = ?", *filter.DashboardID)
+	}
+	if filter.ClusterID != nil {
+		query = query.Where("cluster_id = ?", *filter.ClusterID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var annotations []model.Annotation
+	if err := query.Order("starts_at DESC").Limit(limit).Offset(offset).Find(&annotations).Error; err != nil {
+		return nil, 0, err
+	}
+	return annotations, total, nil
+}
+
+// Get returns one of the user's annotations
+func (s *AnnotationService) Get(userID, id uuid.UUID) (*model.Annotation, error) {
+	var annotation model.Annotation
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&annotation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAnnotationNotFound
+		}
+		return nil, err
+	}
+	return &annotation, nil
+}
+
+// Update changes the fields the request sets on one of the user's annotations
+func (s *AnnotationService) Update(userID, id uuid.UUID, req *model.UpdateAnnotationRequest) (*model.Annotation, error) {
+	annotation, err := s.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Kind != nil {
+		annotation.Kind = *req.Kind
+	}
+	if req.Title != nil {
+		annotation.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.Text != nil {
+		annotation.Text = *req.Text
+	}
+	if req.Tags != nil {
+		annotation.Tags = pq.StringArray(*req.Tags)
+	}
+	if req.StartsAt != nil {
+		annotation.StartsAt = *req.StartsAt
+	}
+	if req.EndsAt != nil {
+		annotation.EndsAt = req.EndsAt
+		if req.EndsAt.IsZero() {
+			annotation.EndsAt = nil
+		}
+	}
+	if annotation.Tags == nil {
+		annotation.Tags = pq.StringArray{}
+	}
+
+	if err := s.validate(userID, annotation.Kind, annotation.Title, annotation.Tags, nil, nil); err != nil {
+		return nil, err
+	}
+	if annotation.EndsAt != nil && annotation.EndsAt.Before(annotation.StartsAt) {
+		return nil, fmt.Errorf("%w: endsAt must not be before startsAt", ErrInvalidAnnotation)
+	}
+	if err := s.db.Save(annotation).Error; err != nil {
+		return nil, err
+	}
+	return annotation, nil
+}
+
+// Delete deletes one of the user's annotations
+func (s *AnnotationService) Delete(userID, id uuid.UUID) error {
+	result := s.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.Annotation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAnnotationNotFound
+	}
+	return nil
+}
+
+// CreateWebhook creates an annotation webhook of the user and returns it with
+// its token, which is not stored and cannot be read again
+func (s *AnnotationService) CreateWebhook(userID uuid.UUID, req *model.CreateAnnotationWebhookRequest) (*model.AnnotationWebhookToken, error) {
+	webhook := model.AnnotationWebhook{
+		UserID:      userID,
+		Name:        strings.TrimSpace(req.Name),
+		Kind:        req.Kind,
+		DashboardID: req.DashboardID,
+		ClusterID:   req.ClusterID,
+		Tags:        pq.StringArray(req.Tags),
+	}
+	if webhook.Kind == "" {
+		webhook.Kind = model.AnnotationDeployment
+	}
+	if webhook.Tags == nil {
+		webhook.Tags = pq.StringArray{}
+	}
+	if webhook.Name == "" || len(webhook.Name) > 255 {
+		return nil, fmt.Errorf("%w: name is required and at most 255 characters", ErrInvalidAnnotation)
+	}
+	if err := s.validate(userID, webhook.Kind, webhook.Name, webhook.Tags, webhook.DashboardID, webhook.ClusterID); err != nil {
+		return nil, err
+	}
+
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	webhook.TokenHash = hash
+	if err := s.db.Create(&webhook).Error; err != nil {
+		return nil, err
+	}
+	return &model.AnnotationWebhookToken{AnnotationWebhook: webhook, Token: token}, nil
+}
+
+// ListWebhooks returns the user's annotation webhooks
+func (s *AnnotationService) ListWebhooks(userID uuid.UUID) ([]model.AnnotationWebhook, error) {
+	var webhooks []model.AnnotationWebhook
+	err := s.db.Where("user_id = ?", userID).Order("name").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// RotateWebhookToken replaces the token of one of the user's webhooks
+func (s *AnnotationService) RotateWebhookToken(userID, id uuid.UUID) (*model.AnnotationWebhookToken, error) {
+	var webhook model.AnnotationWebhook
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&webhook).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAnnotationWebhookNotFound
+		}
+		return nil, err
+	}
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&webhook).Update("token_hash", hash).Error; err != nil {
+		return nil, err
+	}
+	return &model.AnnotationWebhookToken{AnnotationWebhook: webhook, Token: token}, nil
+}
+
+// DeleteWebhook deletes one of the user's webhooks; its annotations are kept
+func (s *AnnotationService) DeleteWebhook(userID, id uuid.UUID) error {
+	result := s.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.AnnotationWebhook{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAnnotationWebhookNotFound
+	}
+	return nil
+}
+
+// HandleInbound records an annotation posted to a webhook by a caller presenting
+// its token. The annotation gets the webhook's scope and tags.
+func (s *AnnotationService) HandleInbound(webhookID uuid.UUID, token string, req *model.InboundAnnotationRequest) (*model.Annotation, error) {
+	var webhook model.AnnotationWebhook
+	if err := s.db.First(&webhook, "id = ?", webhookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAnnotationWebhookNotFound
+		}
+		return nil, err
+	}
+	if token == "" || subtle.ConstantTimeCompare([]byte(hashSecretToken(token)), []byte(webhook.TokenHash)) != 1 {
+		return nil, ErrAnnotationUnauthorized
+	}
+
+	annotation := &model.Annotation{
+		UserID:      webhook.UserID,
+		DashboardID: webhook.DashboardID,
+		ClusterID:   webhook.ClusterID,
+		Kind:        webhook.Kind,
+		Title:       strings.TrimSpace(req.Title),
+		Text:        req.Text,
+		Tags:        append(append(pq.StringArray{}, webhook.Tags...), req.Tags...),
+		EndsAt:      req.EndsAt,
+		Source:      model.AnnotationSourceWebhook,
+		SourceID:    webhook.ID.String(),
+		CreatedBy:   webhook.Name,
+	}
+	if req.Kind != "" {
+		annotation.Kind = req.Kind
+	}
+	if req.StartsAt != nil {
+		annotation.StartsAt = *req.StartsAt
+	}
+	if err := s.Record(annotation); err != nil {
+		return nil, err
+	}
+	s.db.Model(&webhook).Update("last_used_at", time.Now())
+	return annotation, nil
+}
+
+// dashboardAnnotations returns the annotations a dashboard shows between start
+// and end: its own, those of its cluster and those of every dashboard of its
+// owner, with the occurrences of the owner's maintenance windows, oldest first
+func dashboardAnnotations(db *gorm.DB, dashboard *model.PrometheusDashboard, filter *model.DashboardAnnotationFilter, start, end time.Time) ([]model.DashboardAnnotation, error) {
+	if filter == nil {
+		filter = &model.DashboardAnnotationFilter{}
+	}
+	out := []model.DashboardAnnotation{}
+	if filter.Disabled {
+		return out, nil
+	}
+
+	query := db.Where("user_id = ? AND starts_at <= ? AND COALESCE(ends_at, starts_at) >= ?", dashboard.UserID, end, start)
+	if dashboard.ClusterID != nil {
+		query = query.Where("dashboard_id = ? OR (dashboard_id IS NULL AND (cluster_id IS NULL OR cluster_id = ?))", dashboard.ID, *dashboard.ClusterID)
+	} else {
+		query = query.Where("dashboard_id = ? OR (dashboard_id IS NULL AND cluster_id IS NULL)", dashboard.ID)
+	}
+	if len(filter.Kinds) > 0 {
+		query = query.Where("kind IN ?", filter.Kinds)
+	}
+	if len(filter.Tags) > 0 {
+		query = query.Where("tags && ?", pq.StringArray(filter.Tags))
+	}
+	var annotations []model.Annotation
+	if err := query.Order("starts_at").Limit(maxDashboardAnnotations).Find(&annotations).Error; err != nil {
+		return nil, err
+	}
+	for i := range annotations {
+		a := &annotations[i]
+		out = append(out, model.DashboardAnnotation{
+			ID:       &a.ID,
+			Kind:     a.Kind,
+			Title:    a.Title,
+			Text:     a.Text,
+			Tags:     a.Tags,
+			Time:     a.StartsAt,
+			TimeEnd:  a.EndsAt,
+			Source:   a.Source,
+			SourceID: a.SourceID,
+		})
+	}
+
+	// Maintenance windows have no tags, so only dashboards without a tag filter show them
+	if len(filter.Tags) > 0 || (len(filter.Kinds) > 0 && !slices.Contains(filter.Kinds, model.AnnotationMaintenance)) {
+		return out, nil
+	}
+	var windows []model.MaintenanceWindow
+	if err := db.Where("user_id = ? AND starts_at <= ?", dashboard.UserID, end).Find(&windows).Error; err != nil {
+		return nil, err
+	}
+	for i := range windows {
+		for _, occurrence := range maintenanceOccurrences(&windows[i], start, end) {
+			timeEnd := occurrence[1]
+			out = append(out, model.DashboardAnnotation{
+				Kind:     model.AnnotationMaintenance,
+				Title:    windows[i].Name,
+				Text:     windows[i].Description,
+				Tags:     []string{},
+				Time:     occurrence[0],
+				TimeEnd:  &timeEnd,
+				Source:   model.AnnotationSourceMaintenance,
+				SourceID: windows[i].ID.String(),
+			})
+		}
+	}
+	sortDashboardAnnotations(out)
+	if len(out) > maxDashboardAnnotations {
+		out = out[:maxDashboardAnnotations]
+	}
+	return out, nil
+}
+
+// maintenanceOccurrences returns the bounds of the occurrences of a window that
+// overlap start and end
+func maintenanceOccurrences(w *model.MaintenanceWindow, start, end time.Time) [][2]time.Time {
+	duration := w.EndsAt.Sub(w.StartsAt)
+	period := w.Recurrence.Period()
+	first := w.StartsAt
+	if period > 0 && start.Sub(w.StartsAt) > duration {
+		first = w.StartsAt.Add((start.Sub(w.StartsAt) - duration) / period * period)
+	}
+
+	var occurrences [][2]time.Time
+	for from := first; !from.After(end) && len(occurrences) < maxMaintenanceOccurrences; from = from.Add(period) {
+		if w.RecurrenceEnd != nil && from.After(*w.RecurrenceEnd) {
+			break
+		}
+		if w.ExpiredAt != nil && !from.Before(*w.ExpiredAt) {
+			break
+		}
+		to := from.Add(duration)
+		if w.ExpiredAt != nil && w.ExpiredAt.Before(to) {
+			to = *w.ExpiredAt
+		}
+		if !to.Before(start) {
+			occurrences = append(occurrences, [2]time.Time{from, to})
+		}
+		if period == 0 {
+			break
+		}
+	}
+	return occurrences
+}
+
+// sortDashboardAnnotations orders annotations by time
+func sortDashboardAnnotations(annotations []model.DashboardAnnotation) {
+	sort.SliceStable(annotations, func(i, j int) bool {
+		return annotations[i].Time.Before(annotations[j].Time)
+	})
+}
@@ -0,0 +1,211 @@
+// Package service provides the anomaly detection algorithms rules evaluate
+package service
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// minAnomalySamples is the fewest history points a value is judged against
+const minAnomalySamples = 10
+
+// Isolation forest parameters, as in the original paper
+const (
+	isolationTrees     = 100
+	isolationSubsample = 256
+)
+
+// anomalyScore is how a value compares with the history before it
+type anomalyScore struct {
+	Expected   float64
+	Deviation  float64 // standard deviations from Expected
+	Confidence float64 // 0-1
+	Anomalous  bool
+}
+
+// supportsAlgorithm reports whether detectAnomaly evaluates the algorithm. LSTM
+// needs a trained model and is left to Prometheus rules.
+func supportsAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case model.AlgorithmBaseline, model.AlgorithmSTL, model.AlgorithmIsolationForest:
+		return true
+	default:
+		return false
+	}
+}
+
+// detectAnomaly judges value against history, oldest first, with the rule's
+// algorithm. Sensitivity, from 0 to 1, lowers the deviation that counts as
+// anomalous: 2.2 standard deviations at the default 0.95 and 6 at 0.
+func detectAnomaly(algorithm string, history []float64, value, sensitivity float64) (*anomalyScore, error) {
+	if len(history) < minAnomalySamples {
+		return nil, fmt.Errorf("need at least %d samples, have %d", minAnomalySamples, len(history))
+	}
+	if sensitivity <= 0 || sensitivity > 1 {
+		sensitivity = 0.95
+	}
+	threshold := 2 + 4*(1-sensitivity)
+
+	switch algorithm {
+	case model.AlgorithmBaseline:
+		mean, std := meanStd(history)
+		return zScore(value, mean, std, threshold), nil
+	case model.AlgorithmSTL:
+		return trendScore(history, value, threshold), nil
+	case model.AlgorithmIsolationForest:
+		return isolationScore(history, value, sensitivity), nil
+	default:
+		return nil, fmt.Errorf("algorithm %s is not supported", algorithm)
+	}
+}
+
+// zScore scores value by its distance from expected in units of std
+func zScore(value, expected, std, threshold float64) *anomalyScore {
+	score := &anomalyScore{Expected: expected}
+	if std == 0 {
+		// A flat history makes any change anomalous; the deviation is left at 0
+		// as it has no scale
+		if value != expected {
+			score.Confidence, score.Anomalous = 1, true
+		}
+		return score
+	}
+	score.Deviation = math.Abs(value-expected) / std
+	score.Confidence = math.Erf(score.Deviation / math.Sqrt2)
+	score.Anomalous = score.Deviation >= threshold
+	return score
+}
+
+// trendScore removes the linear trend of the history and scores the value's
+// residual against the median and median absolute deviation of the others. It
+// is the trend and remainder of STL; agent samples rarely span a full season.
+func trendScore(history []float64, value, threshold float64) *anomalyScore {
+	n := float64(len(history))
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range history {
+		x := float64(i)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	slope := 0.0
+	if d := n*sumXX - sumX*sumX; d != 0 {
+		slope = (n*sumXY - sumX*sumY) / d
+	}
+	intercept := (sumY - slope*sumX) / n
+
+	residuals := make([]float64, len(history))
+	for i, y := range history {
+		residuals[i] = y - (intercept + slope*float64(i))
+	}
+	center := median(residuals)
+	deviations := make([]float64, len(residuals))
+	for i, r := range residuals {
+		deviations[i] = math.Abs(r - center)
+	}
+	// 1.4826 scales the MAD to a standard deviation for normal data
+	scale := 1.4826 * median(deviations)
+
+	expected := intercept + slope*n + center
+	return zScore(value, expected, scale, threshold)
+}
+
+// isolationScore scores the value by how quickly random splits of the history
+// isolate it. Scores near 1 are anomalies and those of 0.5 or less are not.
+func isolationScore(history []float64, value, sensitivity float64) *anomalyScore {
+	// Seeded so re-evaluating the same history gives the same answer
+	rng := rand.New(rand.NewSource(int64(len(history))))
+	size := len(history)
+	if size > isolationSubsample {
+		size = isolationSubsample
+	}
+
+	sample := make([]float64, size)
+	var totalDepth float64
+	for t := 0; t < isolationTrees; t++ {
+		for i := range sample {
+			sample[i] = history[rng.Intn(len(history))]
+		}
+		totalDepth += isolationDepth(rng, sample, value, 0)
+	}
+	score := math.Pow(2, -(totalDepth/isolationTrees)/averagePathLength(size))
+
+	mean, std := meanStd(history)
+	result := &anomalyScore{Expected: median(history), Confidence: score}
+	if std > 0 {
+		result.Deviation = math.Abs(value-mean) / std
+	}
+	result.Anomalous = score >= 0.6+0.2*(1-sensitivity)
+	return result
+}
+
+// isolationDepth is the path length at which random splits of sample separate
+// value, with the expected remaining length added once the sample stops shrinking
+func isolationDepth(rng *rand.Rand, sample []float64, value float64, depth int) float64 {
+	if len(sample) <= 1 {
+		return float64(depth)
+	}
+	lo, hi := sample[0], sample[0]
+	for _, v := range sample {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	if value < lo || value > hi {
+		// Outside the range the first split always isolates it
+		return float64(depth + 1)
+	}
+	if lo == hi {
+		return float64(depth) + averagePathLength(len(sample))
+	}
+
+	split := lo + rng.Float64()*(hi-lo)
+	var side []float64
+	for _, v := range sample {
+		if (v < split) == (value < split) {
+			side = append(side, v)
+		}
+	}
+	return isolationDepth(rng, side, value, depth+1)
+}
+
+// averagePathLength is the average path length of an unsuccessful binary search
+// tree lookup among n points, which normalizes isolation depths
+func averagePathLength(n int) float64 {
+	if n <= 1 {
+		return 0
+	}
+	if n == 2 {
+		return 1
+	}
+	harmonic := math.Log(float64(n-1)) + 0.5772156649
+	return 2*harmonic - 2*float64(n-1)/float64(n)
+}
+
+// meanStd returns the mean and population standard deviation of values
+func meanStd(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
+
+// median returns the median of values without reordering them
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,637 @@
+// Package service provides the app catalog: curated applications installed in
+// one click as Helm releases, health-checked once installed and tracked
+// through upgrades and uninstalls
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// appCheckInterval is how often installing and upgrading apps are checked
+	appCheckInterval = time.Minute
+	// appSettledCheckInterval is how often apps that settled are checked
+	appSettledCheckInterval = 5 * time.Minute
+	// appSettleTimeout is how long an app has to become healthy after a change
+	appSettleTimeout = 15 * time.Minute
+	// appCheckTimeout bounds the health checks of one app
+	appCheckTimeout = 30 * time.Second
+	// appInstanceLabel is the label Helm charts put on the objects of a release
+	appInstanceLabel = "app.kubernetes.io/instance"
+)
+
+var (
+	// ErrAppNotFound is returned for apps that are not in the catalog
+	ErrAppNotFound = errors.New("app not found")
+	// ErrInvalidAppInstall is returned for installs and upgrades whose inputs are malformed
+	ErrInvalidAppInstall = errors.New("invalid app installation")
+	// ErrAppInstallationNotFound is returned when the installation does not exist or belongs to another user
+	ErrAppInstallationNotFound = errors.New("app installation not found")
+	// ErrAppInstalled is returned when the release an install would create exists
+	ErrAppInstalled = errors.New("app is already installed")
+)
+
+// AppCatalogService installs the apps of the catalog through the Helm release
+// service and checks their health
+type AppCatalogService struct {
+	db            *gorm.DB
+	logger        *zap.Logger
+	releases      *HelmReleaseService
+	events        *EventBus
+	notifications *NotificationService
+}
+
+// NewAppCatalogService creates a new app catalog service
+func NewAppCatalogService(db *gorm.DB, logger *zap.Logger, releases *HelmReleaseService) *AppCatalogService {
+	return &AppCatalogService{
+		db:            db,
+		logger:        logger,
+		releases:      releases,
+		notifications: NewNotificationService(db, logger),
+	}
+}
+
+// SetEventBus sets the bus health changes are published on
+func (s *AppCatalogService) SetEventBus(events *EventBus) {
+	s.events = events
+	s.notifications.SetEventBus(events)
+}
+
+// Apps lists the apps of the catalog, those of a category when it is set
+func (s *AppCatalogService) Apps(category string) []model.AppCatalogEntry {
+	apps := make([]model.AppCatalogEntry, 0, len(appCatalog))
+	for _, app := range appCatalog {
+		if category == "" || app.Category == category {
+			apps = append(apps, app)
+		}
+	}
+	return apps
+}
+
+// App gets an app of the catalog
+func (s *AppCatalogService) App(id string) (*model.AppCatalogEntry, error) {
+	for i := range appCatalog {
+		if appCatalog[i].ID == id {
+			return &appCatalog[i], nil
+		}
+	}
+	return nil, ErrAppNotFound
+}
+
+// Install installs the app in the user's cluster as a Helm release of its
+// chart, with its default values and the inputs set. The chart's repository
+// is registered for the user if it is not yet.
+func (s *AppCatalogService) Install(ctx context.Context, userID uuid.UUID, changedBy, appID string, req *model.InstallAppRequest) (*model.AppInstallation, error) {
+	app, err := s.App(appID)
+	if err != nil {
+		return nil, err
+	}
+	namespace := strings.TrimSpace(req.Namespace)
+	if namespace == "" {
+		namespace = app.DefaultNamespace
+	}
+	name := strings.TrimSpace(req.ReleaseName)
+	if name == "" {
+		name = app.ID
+	}
+	values, inputs, err := appValues(app, req.Inputs, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("id = ? AND user_id = ?", req.ClusterID, userID).First(&model.K8sCluster{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrClusterNotFound
+		}
+		return nil, err
+	}
+
+	var existing int64
+	if err := s.db.Model(&model.HelmRelease{}).
+		Where("cluster_id = ? AND namespace = ? AND name = ?", req.ClusterID, namespace, name).
+		Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("%w: a release named %s exists in namespace %s", ErrAppInstalled, name, namespace)
+	}
+
+	repo, err := s.repository(userID, app)
+	if err != nil {
+		return nil, err
+	}
+	release, err := s.releases.Install(ctx, userID, changedBy, &model.CreateHelmReleaseRequest{
+		ClusterID:    req.ClusterID,
+		Namespace:    namespace,
+		Name:         name,
+		Chart:        repo + "/" + app.Chart,
+		ChartVersion: app.ChartVersion,
+		Values:       values,
+		Description:  "Installed " + app.Name + " from the app catalog",
+		Notify:       req.Notify,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	installation := &model.AppInstallation{
+		ID:              uuid.New(),
+		UserID:          userID,
+		AppID:           app.ID,
+		ClusterID:       release.ClusterID,
+		Namespace:       release.Namespace,
+		ReleaseName:     release.Name,
+		ReleaseID:       release.ID,
+		ChartVersion:    release.ChartVersion,
+		Inputs:          inputs,
+		Status:          model.AppInstalling,
+		StatusChangedAt: time.Now(),
+		Checks:          []model.AppHealthCheck{},
+		Notify:          req.Notify,
+		CreatedBy:       changedBy,
+	}
+	if err := s.db.Create(installation).Error; err != nil {
+		return nil, err
+	}
+	s.logger.Info("app installation requested", zap.String("app", app.ID),
+		zap.String("clusterId", release.ClusterID.String()), zap.String("namespace", release.Namespace))
+	return installation, nil
+}
+
+// Installations lists the user's installed apps, newest first, optionally of
+// one cluster or in one status
+func (s *AppCatalogService) Installations(userID uuid.UUID, clusterID *uuid.UUID, status model.AppInstallationStatus) ([]model.AppInstallation, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if clusterID != nil {
+		query = query.Where("cluster_id = ?", *clusterID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	installations := []model.AppInstallation{}
+	if err := query.Order("created_at DESC").Find(&installations).Error; err != nil {
+		return nil, err
+	}
+	return installations, nil
+}
+
+// Installation gets an installed app of the user
+func (s *AppCatalogService) Installation(userID, id uuid.UUID) (*model.AppInstallation, error) {
+	var installation model.AppInstallation
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&installation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAppInstallationNotFound
+		}
+		return nil, err
+	}
+	return &installation, nil
+}
+
+// Upgrade upgrades the app's release with the inputs changed, or to another
+// chart version, and checks its health again
+func (s *AppCatalogService) Upgrade(ctx context.Context, userID uuid.UUID, changedBy string, id uuid.UUID, req *model.UpgradeAppRequest) (*model.AppInstallation, error) {
+	installation, err := s.Installation(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if installation.Status == model.AppUninstalled {
+		return nil, fmt.Errorf("%w: the app was uninstalled", ErrInvalidAppInstall)
+	}
+	app, err := s.App(installation.AppID)
+	if err != nil {
+		return nil, err
+	}
+	release, err := s.releases.release(userID, installation.ReleaseID)
+	if err != nil {
+		return nil, err
+	}
+	current, _ := parseHelmValues(release.Values)
+	values, inputs, err := appValues(app, req.Inputs, installation.Inputs, current)
+	if err != nil {
+		return nil, err
+	}
+	if req.Notify != nil {
+		installation.Notify = *req.Notify
+	}
+
+	release, err = s.releases.Upgrade(ctx, userID, changedBy, release.ID, &model.UpdateHelmReleaseRequest{
+		ChartVersion: strings.TrimSpace(req.ChartVersion),
+		Values:       values,
+		Notify:       installation.Notify,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	installation.ChartVersion = release.ChartVersion
+	installation.Inputs = inputs
+	installation.Status = model.AppUpgrading
+	installation.StatusChangedAt = time.Now()
+	if err := s.db.Save(installation).Error; err != nil {
+		return nil, err
+	}
+	return installation, nil
+}
+
+// Uninstall removes the app's release and keeps the installation, uninstalled,
+// for the record
+func (s *AppCatalogService) Uninstall(userID, id uuid.UUID) (*model.AppInstallation, error) {
+	installation, err := s.Installation(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if installation.Status == model.AppUninstalled {
+		return installation, nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// TODO: Uninstall through the Helm engine once it deploys releases
+		if err := tx.Where("id = ? AND user_id = ?", installation.ReleaseID, userID).Delete(&model.HelmRelease{}).Error; err != nil {
+			return err
+		}
+		installation.Status = model.AppUninstalled
+		installation.StatusChangedAt = time.Now()
+		installation.Checks = []model.AppHealthCheck{}
+		return tx.Save(installation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return installation, nil
+}
+
+// Check runs the health checks of an installed app now
+func (s *AppCatalogService) Check(ctx context.Context, userID, id uuid.UUID) (*model.AppInstallation, error) {
+	installation, err := s.Installation(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if installation.Status == model.AppUninstalled {
+		return nil, fmt.Errorf("%w: the app was uninstalled", ErrInvalidAppInstall)
+	}
+	s.check(ctx, installation, time.Now())
+	return installation, nil
+}
+
+// Run checks the health of installed apps until ctx is cancelled: those that
+// are installing or upgrading every minute, the others every five
+func (s *AppCatalogService) Run(ctx context.Context) {
+	ticker := time.NewTicker(appCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.CheckDue(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckDue checks the installed apps whose health is due to be checked
+func (s *AppCatalogService) CheckDue(ctx context.Context, now time.Time) {
+	var installations []model.AppInstallation
+	err := s.db.Where("status IN ? OR (status IN ? AND (checked_at IS NULL OR checked_at < ?))",
+		[]model.AppInstallationStatus{model.AppInstalling, model.AppUpgrading},
+		[]model.AppInstallationStatus{model.AppHealthy, model.AppDegraded, model.AppFailed},
+		now.Add(-appSettledCheckInterval)).
+		Find(&installations).Error
+	if err != nil {
+		s.logger.Error("failed to load app installations for health checks", zap.Error(err))
+		return
+	}
+	for i := range installations {
+		if ctx.Err() != nil {
+			return
+		}
+		s.check(ctx, &installations[i], now)
+	}
+}
+
+// check runs the installation's health checks and records them with the
+// status they lead to. Only the checker that moves the status announces it.
+func (s *AppCatalogService) check(ctx context.Context, installation *model.AppInstallation, now time.Time) {
+	app, _ := s.App(installation.AppID)
+	checks := s.probe(ctx, installation, app)
+	passed := len(checks) > 0
+	for _, check := range checks {
+		passed = passed && check.Passed
+	}
+
+	from := installation.Status
+	installation.Checks = checks
+	installation.CheckedAt = &now
+	installation.Status = nextAppStatus(from, passed, installation.StatusChangedAt, now)
+	if installation.Status != from {
+		installation.StatusChangedAt = now
+	}
+	result := s.db.Model(installation).Where("status = ?", from).
+		Select("Checks", "CheckedAt", "Status", "StatusChangedAt").Updates(installation)
+	if result.Error != nil {
+		s.logger.Error("failed to record app health checks", zap.String("installationId", installation.ID.String()), zap.Error(result.Error))
+		return
+	}
+	if result.RowsAffected == 1 && installation.Status != from {
+		s.announce(installation, app)
+	}
+}
+
+// probe checks the release's objects in the cluster: its deployments must be
+// available, at least as many as the app has, and its pods ready
+func (s *AppCatalogService) probe(ctx context.Context, installation *model.AppInstallation, app *model.AppCatalogEntry) []model.AppHealthCheck {
+	failed := func(message string) []model.AppHealthCheck {
+		return []model.AppHealthCheck{{Name: "cluster", Passed: false, Message: message}}
+	}
+	var cluster model.K8sCluster
+	if err := s.db.First(&cluster, "id = ?", installation.ClusterID).Error; err != nil {
+		return failed("Cluster not found")
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return failed("Failed to connect to the cluster: " + err.Error())
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, appCheckTimeout)
+	defer cancel()
+
+	deployments, err := client.GetDeployments(ctx, installation.Namespace)
+	if err != nil {
+		return failed(err.Error())
+	}
+	pods, err := client.GetPods(ctx, installation.Namespace)
+	if err != nil {
+		return failed(err.Error())
+	}
+
+	checks := []model.AppHealthCheck{}
+	found := 0
+	for _, deployment := range deployments {
+		if deployment.Labels[appInstanceLabel] != installation.ReleaseName {
+			continue
+		}
+		found++
+		checks = append(checks, model.AppHealthCheck{
+			Name:    "deployment/" + deployment.Name,
+			Passed:  deployment.AvailableReplicas >= deployment.Replicas && deployment.UpdatedReplicas >= deployment.Replicas,
+			Message: fmt.Sprintf("%d of %d replicas available", deployment.AvailableReplicas, deployment.Replicas),
+		})
+	}
+	if app != nil && app.MinDeployments > 0 {
+		checks = append(checks, model.AppHealthCheck{
+			Name:    "deployments",
+			Passed:  found >= app.MinDeployments,
+			Message: fmt.Sprintf("%d deployments found, %d expected", found, app.MinDeployments),
+		})
+	}
+
+	ready, total := 0, 0
+	var waiting []string
+	for _, pod := range pods {
+		if pod.Labels[appInstanceLabel] != installation.ReleaseName || pod.Phase == "Succeeded" {
+			continue
+		}
+		total++
+		if pod.Ready {
+			ready++
+		} else if len(waiting) < 5 {
+			waiting = append(waiting, pod.Name)
+		}
+	}
+	message := fmt.Sprintf("%d of %d pods ready", ready, total)
+	if len(waiting) > 0 {
+		message += "; not ready: " + strings.Join(waiting, ", ")
+	}
+	checks = append(checks, model.AppHealthCheck{Name: "pods", Passed: total > 0 && ready == total, Message: message})
+	return checks
+}
+
+// nextAppStatus returns the status an installation moves to from its health
+// checks. Installs and upgrades have appSettleTimeout to become healthy.
+func nextAppStatus(current model.AppInstallationStatus, passed bool, since, now time.Time) model.AppInstallationStatus {
+	if passed {
+		return model.AppHealthy
+	}
+	switch current {
+	case model.AppInstalling, model.AppUpgrading:
+		if now.Sub(since) > appSettleTimeout {
+			return model.AppFailed
+		}
+	case model.AppHealthy:
+		return model.AppDegraded
+	}
+	return current
+}
+
+// announce publishes a change of the installation's status and, when it asked
+// for notifications, notifies the user
+func (s *AppCatalogService) announce(installation *model.AppInstallation, app *model.AppCatalogEntry) {
+	s.events.Publish(installation.UserID, model.EventAppHealthChanged, map[string]string{
+		"installationId": installation.ID.String(),
+		"appId":          installation.AppID,
+		"clusterId":      installation.ClusterID.String(),
+		"status":         string(installation.Status),
+	}, installation)
+	if !installation.Notify {
+		return
+	}
+
+	name := installation.AppID
+	if app != nil {
+		name = app.Name
+	}
+	title := fmt.Sprintf("%s is healthy in namespace %s", name, installation.Namespace)
+	priority := model.NotificationPriorityLow
+	switch installation.Status {
+	case model.AppDegraded:
+		title = fmt.Sprintf("%s is degraded in namespace %s", name, installation.Namespace)
+		priority = model.NotificationPriorityHigh
+	case model.AppFailed:
+		title = fmt.Sprintf("%s did not become healthy in namespace %s", name, installation.Namespace)
+		priority = model.NotificationPriorityHigh
+	}
+	var failing []string
+	for _, check := range installation.Checks {
+		if !check.Passed {
+			failing = append(failing, check.Name+": "+check.Message)
+		}
+	}
+	text := "All health checks passed"
+	if len(failing) > 0 {
+		text = strings.Join(failing, "\n")
+	}
+	if _, err := s.notifications.CreateSourcedNotification(installation.UserID, model.NotificationSourceHelm, model.NotificationTypeSystem, title, text, priority); err != nil {
+		s.logger.Error("failed to notify app health change", zap.String("installationId", installation.ID.String()), zap.Error(err))
+	}
+}
+
+// repository returns the name of the user's repository of the app's chart,
+// registering it when the user has none with its URL
+func (s *AppCatalogService) repository(userID uuid.UUID, app *model.AppCatalogEntry) (string, error) {
+	var repos []model.HelmRepository
+	if err := s.db.Where("user_id = ?", userID).Find(&repos).Error; err != nil {
+		return "", err
+	}
+	taken := make(map[string]bool, len(repos))
+	for _, repo := range repos {
+		if strings.TrimSuffix(repo.URL, "/") == strings.TrimSuffix(app.RepositoryURL, "/") {
+			return repo.Name, nil
+		}
+		taken[repo.Name] = true
+	}
+
+	name := app.Repository
+	if taken[name] {
+		name = "catalog-" + app.Repository
+	}
+	if taken[name] {
+		return "", fmt.Errorf("%w: repository names %s and %s are taken by other repositories", ErrInvalidAppInstall, app.Repository, name)
+	}
+	repo := &model.HelmRepository{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Name:        name,
+		Description: "Registered by the app catalog for " + app.Name,
+		Type:        model.HelmRepoTypeHTTPS,
+		Status:      model.HelmRepoStatusActive,
+		URL:         app.RepositoryURL,
+	}
+	if err := s.db.Create(repo).Error; err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// appValues builds the values document of an app from its default values and
+// inputs. Inputs that are not given keep their previous value, secret ones
+// the value in the release's current values, then fall back to their default.
+// It returns the inputs to store, without the secret ones.
+func appValues(app *model.AppCatalogEntry, given, previous, current map[string]interface{}) (string, map[string]interface{}, error) {
+	values, err := parseHelmValues(app.DefaultValues)
+	if err != nil {
+		return "", nil, err
+	}
+	known := make(map[string]bool, len(app.Inputs))
+	stored := map[string]interface{}{}
+	for _, input := range app.Inputs {
+		known[input.Key] = true
+		value, ok := given[input.Key]
+		if !ok && !input.Secret {
+			value, ok = previous[input.Key]
+		}
+		if !ok && input.Secret {
+			value = lookupHelmValue(current, input.Key)
+			ok = value != nil
+		}
+		if !ok || value == nil {
+			value = input.Default
+		}
+		if value == nil || value == "" {
+			if input.Required {
+				return "", nil, fmt.Errorf("%w: %s is required", ErrInvalidAppInstall, input.Label)
+			}
+			continue
+		}
+		value, err := appInputValue(&input, value)
+		if err != nil {
+			return "", nil, err
+		}
+		setHelmValue(values, input.Key, value)
+		if !input.Secret {
+			stored[input.Key] = value
+		}
+	}
+	for key := range given {
+		if !known[key] {
+			return "", nil, fmt.Errorf("%w: %s has no input %s", ErrInvalidAppInstall, app.Name, key)
+		}
+	}
+	return helmToYAML(values) + "\n", stored, nil
+}
+
+// appInputValue checks a value against its input and converts it to the type
+// it is set in the values with
+func appInputValue(input *model.AppCatalogInput, value interface{}) (interface{}, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s %s", ErrInvalidAppInstall, input.Label, fmt.Sprintf(format, args...))
+	}
+	switch input.Type {
+	case model.AppInputBoolean:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, invalid("must be true or false")
+		}
+		return b, nil
+	case model.AppInputInteger:
+		var n int64
+		switch v := value.(type) {
+		case int:
+			n = int64(v)
+		case int64:
+			n = v
+		case float64:
+			if v != math.Trunc(v) || math.Abs(v) > 1<<53 {
+				return nil, invalid("must be a whole number")
+			}
+			n = int64(v)
+		default:
+			return nil, invalid("must be a whole number")
+		}
+		if input.Minimum != nil && n < *input.Minimum {
+			return nil, invalid("must be at least %d", *input.Minimum)
+		}
+		if input.Maximum != nil && n > *input.Maximum {
+			return nil, invalid("must be at most %d", *input.Maximum)
+		}
+		return n, nil
+	case model.AppInputSelect:
+		s, _ := value.(string)
+		for _, option := range input.Options {
+			if s == option {
+				return s, nil
+			}
+		}
+		return nil, invalid("must be one of %s", strings.Join(input.Options, ", "))
+	default:
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid("must be text")
+		}
+		if input.Pattern != "" {
+			if re, err := regexp.Compile(input.Pattern); err == nil && !re.MatchString(s) {
+				if input.Secret {
+					return nil, invalid("is not in the expected format")
+				}
+				return nil, invalid("must match %s", input.Pattern)
+			}
+		}
+		return s, nil
+	}
+}
+
+// setHelmValue sets the value at a dotted path, creating the maps on the way
+func setHelmValue(values map[string]interface{}, dotted string, value interface{}) {
+	keys := strings.Split(dotted, ".")
+	current := values
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			current[key] = next
+		}
+		current = next
+	}
+	current[keys[len(keys)-1]] = value
+}
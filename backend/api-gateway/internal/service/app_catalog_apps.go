@@ -0,0 +1,83 @@
+// Package service provides the curated applications of the app catalog
+package service
+
+import "github.com/wangjialin/myops/pkg/model"
+
+// appCatalog lists the applications users can install in one click. Chart
+// versions are pinned so installs are reproducible; they are raised here as
+// the platform validates new releases.
+var appCatalog = []model.AppCatalogEntry{
+	{
+		ID:               "ingress-nginx",
+		Name:             "Ingress NGINX",
+		Description:      "Ingress controller that routes HTTP and HTTPS traffic into the cluster with NGINX",
+		Category:         "networking",
+		Home:             "https://kubernetes.github.io/ingress-nginx",
+		Repository:       "ingress-nginx",
+		RepositoryURL:    "https://kubernetes.github.io/ingress-nginx",
+		Chart:            "ingress-nginx",
+		ChartVersion:     "4.11.3",
+		DefaultNamespace: "ingress-nginx",
+		DefaultValues: `controller:
+  metrics:
+    enabled: true
+  admissionWebhooks:
+    enabled: true
+`,
+		Inputs: []model.AppCatalogInput{
+			{Key: "controller.replicaCount", Label: "Replicas", Description: "Controller pods serving traffic", Type: model.AppInputInteger, Default: 1, Minimum: appInputBound(1), Maximum: appInputBound(20)},
+			{Key: "controller.service.type", Label: "Service type", Description: "How the controller is exposed outside the cluster", Type: model.AppInputSelect, Default: "LoadBalancer", Options: []string{"LoadBalancer", "NodePort", "ClusterIP"}},
+			{Key: "controller.ingressClassResource.default", Label: "Default ingress class", Description: "Serve ingresses that name no ingress class", Type: model.AppInputBoolean, Default: false},
+		},
+		MinDeployments: 1,
+	},
+	{
+		ID:               "cert-manager",
+		Name:             "cert-manager",
+		Description:      "Issues and renews TLS certificates from Let's Encrypt and other issuers as Kubernetes resources",
+		Category:         "security",
+		Home:             "https://cert-manager.io",
+		Repository:       "jetstack",
+		RepositoryURL:    "https://charts.jetstack.io",
+		Chart:            "cert-manager",
+		ChartVersion:     "v1.16.1",
+		DefaultNamespace: "cert-manager",
+		DefaultValues: `crds:
+  keep: true
+`,
+		Inputs: []model.AppCatalogInput{
+			{Key: "crds.enabled", Label: "Install CRDs", Description: "Install the Certificate, Issuer and related custom resource definitions with the chart", Type: model.AppInputBoolean, Default: true},
+			{Key: "replicaCount", Label: "Replicas", Description: "Controller pods; one is active at a time", Type: model.AppInputInteger, Default: 1, Minimum: appInputBound(1), Maximum: appInputBound(5)},
+			{Key: "prometheus.enabled", Label: "Expose metrics", Description: "Serve Prometheus metrics from the controller", Type: model.AppInputBoolean, Default: true},
+		},
+		MinDeployments: 3, // Controller, webhook and CA injector
+	},
+	{
+		ID:               "kube-prometheus",
+		Name:             "Kube Prometheus",
+		Description:      "Prometheus, Alertmanager and Grafana with dashboards and alerts for the cluster, managed by the Prometheus operator",
+		Category:         "monitoring",
+		Home:             "https://github.com/prometheus-community/helm-charts/tree/main/charts/kube-prometheus-stack",
+		Repository:       "prometheus-community",
+		RepositoryURL:    "https://prometheus-community.github.io/helm-charts",
+		Chart:            "kube-prometheus-stack",
+		ChartVersion:     "65.5.0",
+		DefaultNamespace: "monitoring",
+		DefaultValues: `prometheus:
+  prometheusSpec:
+    serviceMonitorSelectorNilUsesHelmValues: false
+    podMonitorSelectorNilUsesHelmValues: false
+`,
+		Inputs: []model.AppCatalogInput{
+			{Key: "grafana.adminPassword", Label: "Grafana admin password", Type: model.AppInputString, Required: true, Pattern: `^.{8,}$`, Secret: true},
+			{Key: "prometheus.prometheusSpec.retention", Label: "Retention", Description: "How long Prometheus keeps metrics, such as 10d or 12h", Type: model.AppInputString, Default: "10d", Pattern: `^[0-9]+(ms|s|m|h|d|w|y)$`},
+			{Key: "alertmanager.enabled", Label: "Alertmanager", Description: "Route the stack's alerts through Alertmanager", Type: model.AppInputBoolean, Default: true},
+			{Key: "grafana.enabled", Label: "Grafana", Description: "Install Grafana with the cluster dashboards", Type: model.AppInputBoolean, Default: true},
+		},
+		MinDeployments: 2, // Operator and kube-state-metrics, and Grafana when enabled
+	},
+}
+
+func appInputBound(n int64) *int64 {
+	return &n
+}
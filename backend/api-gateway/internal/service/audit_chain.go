@@ -0,0 +1,449 @@
+// Package service provides the tamper-evident audit log chain
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// auditSealInterval is how often new audit records are sealed into the chain
+	auditSealInterval = 10 * time.Second
+	// auditChainBatch is how many records are sealed, verified or exported at a time
+	auditChainBatch = 1000
+	// auditChainLockKey is the advisory lock that keeps one gateway sealing at a time
+	auditChainLockKey = 0x61756469 // "audi"
+	// auditChainMaxProblems bounds the problems a verification lists
+	auditChainMaxProblems = 100
+	// auditExportTimeout bounds the export of one checkpoint
+	auditExportTimeout = 5 * time.Minute
+)
+
+// ErrInvalidAuditChainRange is returned for verification ranges that are out of order
+var ErrInvalidAuditChainRange = errors.New("invalid audit chain range")
+
+// AuditChainService seals audit records into a hash chain, where each record
+// stores the hash of the one before it, and anchors the chain with periodic
+// checkpoints exported once to a backup target. Records are sealed shortly
+// after they are written, in the order they are sealed rather than created;
+// once sealed, the database refuses changes to them.
+type AuditChainService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	settings *SettingsService
+}
+
+// NewAuditChainService creates a new audit chain service
+func NewAuditChainService(db *gorm.DB, logger *zap.Logger, settings *SettingsService) *AuditChainService {
+	return &AuditChainService{
+		db:       db,
+		logger:   logger,
+		settings: settings,
+	}
+}
+
+// Run seals new records, checkpoints the chain and exports checkpoints until ctx is done
+func (s *AuditChainService) Run(ctx context.Context) {
+	ticker := time.NewTicker(auditSealInterval)
+	defer ticker.Stop()
+	for {
+		// Full batches mean more records are waiting
+		for {
+			sealed, err := s.Seal()
+			if err != nil {
+				s.logger.Error("failed to seal audit records", zap.Error(err))
+			}
+			if err != nil || sealed < auditChainBatch || ctx.Err() != nil {
+				break
+			}
+		}
+		if err := s.checkpointDue(); err != nil {
+			s.logger.Error("failed to checkpoint audit chain", zap.Error(err))
+		}
+		s.exportPending(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// auditRecordHash hashes a record with the hash of the one before it
+func auditRecordHash(record *model.AuditLog, sequence int64, prevHash string) string {
+	data, _ := json.Marshal(struct {
+		Sequence   int64  `json:"sequence"`
+		PrevHash   string `json:"prevHash"`
+		ID         string `json:"id"`
+		UserID     string `json:"userId"`
+		Username   string `json:"username"`
+		Action     string `json:"action"`
+		Resource   string `json:"resource"`
+		ResourceID string `json:"resourceId"`
+		Method     string `json:"method"`
+		Path       string `json:"path"`
+		IPAddress  string `json:"ipAddress"`
+		UserAgent  string `json:"userAgent"`
+		StatusCode int    `json:"statusCode"`
+		ErrorMsg   string `json:"errorMsg"`
+		OldValue   string `json:"oldValue"`
+		NewValue   string `json:"newValue"`
+		CreatedAt  int64  `json:"createdAt"` // Microseconds, the precision the database keeps
+	}{
+		Sequence:   sequence,
+		PrevHash:   prevHash,
+		ID:         record.ID.String(),
+		UserID:     record.UserID.String(),
+		Username:   record.Username,
+		Action:     record.Action,
+		Resource:   record.Resource,
+		ResourceID: record.ResourceID,
+		Method:     record.Method,
+		Path:       record.Path,
+		IPAddress:  record.IPAddress,
+		UserAgent:  record.UserAgent,
+		StatusCode: record.StatusCode,
+		ErrorMsg:   record.ErrorMsg,
+		OldValue:   record.OldValue,
+		NewValue:   record.NewValue,
+		CreatedAt:  record.CreatedAt.UnixMicro(),
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Seal appends a batch of unsealed records to the chain and returns how many it
+// sealed. Another gateway sealing at the same time makes it seal none.
+func (s *AuditChainService) Seal() (int, error) {
+	sealed := 0
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", auditChainLockKey).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		head, err := chainHead(tx)
+		if err != nil {
+			return err
+		}
+		var records []model.AuditLog
+		if err := tx.Where("sequence IS NULL").Order("created_at, id").Limit(auditChainBatch).Find(&records).Error; err != nil {
+			return err
+		}
+
+		sequence, prevHash := int64(0), ""
+		if head != nil {
+			sequence, prevHash = *head.Sequence, head.Hash
+		}
+		for i := range records {
+			sequence++
+			hash := auditRecordHash(&records[i], sequence, prevHash)
+			if err := tx.Model(&model.AuditLog{}).Where("id = ?", records[i].ID).Updates(map[string]interface{}{
+				"sequence":  sequence,
+				"prev_hash": prevHash,
+				"hash":      hash,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to seal audit record %s: %w", records[i].ID, err)
+			}
+			prevHash = hash
+		}
+		sealed = len(records)
+		return nil
+	})
+	return sealed, err
+}
+
+// chainHead returns the last sealed record, or nil before the first
+func chainHead(tx *gorm.DB) (*model.AuditLog, error) {
+	var head model.AuditLog
+	err := tx.Select("id", "sequence", "hash").Where("sequence IS NOT NULL").Order("sequence DESC").First(&head).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &head, nil
+}
+
+// checkpointDue checkpoints the chain when the interval has passed since the
+// last checkpoint and records were sealed since
+func (s *AuditChainService) checkpointDue() error {
+	var last model.AuditCheckpoint
+	err := s.db.Order("sequence DESC").First(&last).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil && time.Since(last.CreatedAt) < s.settings.Duration(model.SettingAuditCheckpointInterval) {
+		return nil
+	}
+	_, err = s.Checkpoint()
+	return err
+}
+
+// Checkpoint anchors the chain at its last sealed record. It returns nil when no
+// records were sealed since the last checkpoint.
+func (s *AuditChainService) Checkpoint() (*model.AuditCheckpoint, error) {
+	var checkpoint *model.AuditCheckpoint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLockKey).Error; err != nil {
+			return err
+		}
+		head, err := chainHead(tx)
+		if err != nil || head == nil {
+			return err
+		}
+		var last model.AuditCheckpoint
+		from := int64(1)
+		err = tx.Order("sequence DESC").First(&last).Error
+		if err == nil {
+			from = last.Sequence + 1
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if *head.Sequence < from {
+			return nil
+		}
+		checkpoint = &model.AuditCheckpoint{FromSequence: from, Sequence: *head.Sequence, Hash: head.Hash}
+		return tx.Create(checkpoint).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to checkpoint audit chain: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// ListCheckpoints lists the most recent checkpoints, newest first
+func (s *AuditChainService) ListCheckpoints(limit int) ([]model.AuditCheckpoint, int64, error) {
+	var total int64
+	if err := s.db.Model(&model.AuditCheckpoint{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	checkpoints := []model.AuditCheckpoint{}
+	if err := s.db.Order("sequence DESC").Limit(limit).Find(&checkpoints).Error; err != nil {
+		return nil, 0, err
+	}
+	return checkpoints, total, nil
+}
+
+// exportPending exports the checkpoints not yet written to the export target
+func (s *AuditChainService) exportPending(ctx context.Context) {
+	name := s.settings.String(model.SettingAuditExportTarget)
+	if name == "" {
+		return
+	}
+	var target model.BackupTarget
+	if err := s.db.Where("name = ?", name).First(&target).Error; err != nil {
+		s.logger.Warn("audit export target not found", zap.String("target", name), zap.Error(err))
+		return
+	}
+	storage, err := NewBackupStorage(&target)
+	if err != nil {
+		s.logger.Warn("audit export target is invalid", zap.String("target", name), zap.Error(err))
+		return
+	}
+
+	var pending []model.AuditCheckpoint
+	if err := s.db.Where("exported_at IS NULL").Order("sequence").Limit(10).Find(&pending).Error; err != nil {
+		s.logger.Error("failed to load audit checkpoints", zap.Error(err))
+		return
+	}
+	for i := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		s.export(ctx, storage, &target, &pending[i])
+	}
+}
+
+// export writes a checkpoint and the records it covers to storage, as JSON lines
+// of the records followed by the checkpoint. An export is only ever written
+// once; a key already stored means another gateway exported it.
+func (s *AuditChainService) export(ctx context.Context, storage BackupStorage, target *model.BackupTarget, checkpoint *model.AuditCheckpoint) {
+	ctx, cancel := context.WithTimeout(ctx, auditExportTimeout)
+	defer cancel()
+
+	key := fmt.Sprintf("audit/%012d-%012d.jsonl", checkpoint.FromSequence, checkpoint.Sequence)
+	updates := map[string]interface{}{"export_target_id": target.ID, "export_key": key}
+
+	data, err := s.exportData(checkpoint)
+	if err == nil {
+		var retainUntil *time.Time
+		if days := s.settings.Int(model.SettingAuditExportRetention); days > 0 {
+			until := time.Now().AddDate(0, 0, days)
+			retainUntil = &until
+		}
+		err = storage.PutOnce(ctx, key, data, retainUntil)
+		if errors.Is(err, ErrBackupObjectExists) {
+			err = nil
+		}
+	}
+	if err != nil {
+		s.logger.Warn("failed to export audit checkpoint",
+			zap.Int64("sequence", checkpoint.Sequence),
+			zap.String("target", target.Name),
+			zap.Error(err),
+		)
+		updates["export_error"] = err.Error()
+	} else {
+		updates["exported_at"] = time.Now()
+		updates["export_error"] = ""
+	}
+	if err := s.db.Model(checkpoint).Updates(updates).Error; err != nil {
+		s.logger.Error("failed to record audit export", zap.Error(err))
+	}
+}
+
+// exportData renders the records of a checkpoint and the checkpoint
+func (s *AuditChainService) exportData(checkpoint *model.AuditCheckpoint) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for from := checkpoint.FromSequence; from <= checkpoint.Sequence; from += auditChainBatch {
+		var records []model.AuditLog
+		err := s.db.Where("sequence >= ? AND sequence < ? AND sequence <= ?", from, from+auditChainBatch, checkpoint.Sequence).
+			Order("sequence").Find(&records).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to load audit records: %w", err)
+		}
+		for i := range records {
+			if err := enc.Encode(records[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := enc.Encode(map[string]interface{}{"checkpoint": checkpoint}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Verify checks the chain between two sequences, the whole chain when they are
+// zero. It recomputes each record's hash, and reports missing sequences, records
+// that changed or no longer follow the one before, and checkpoints the chain no
+// longer matches, such as when its newest records were deleted.
+func (s *AuditChainService) Verify(from, to int64) (*model.AuditChainVerification, error) {
+	if from < 0 || to < 0 || (to > 0 && from > to) {
+		return nil, ErrInvalidAuditChainRange
+	}
+	result := &model.AuditChainVerification{Problems: []model.AuditChainProblem{}, VerifiedAt: time.Now()}
+	problem := func(sequence int64, kind, format string, args ...interface{}) {
+		if len(result.Problems) == auditChainMaxProblems {
+			result.Truncated = true
+			return
+		}
+		result.Problems = append(result.Problems, model.AuditChainProblem{Sequence: sequence, Kind: kind, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if err := s.db.Model(&model.AuditLog{}).Where("sequence IS NULL").Count(&result.Unsealed).Error; err != nil {
+		return nil, err
+	}
+	head, err := chainHead(s.db)
+	if err != nil {
+		return nil, err
+	}
+	if from == 0 {
+		from = 1
+	}
+	if head != nil && (to == 0 || to > *head.Sequence) {
+		to = *head.Sequence
+	}
+	result.FirstSequence, result.LastSequence = from, to
+
+	// Records are hashed with the hash of the record before the range
+	expected, prevHash := from, ""
+	if head != nil && from > 1 && from <= to {
+		var prev model.AuditLog
+		if err := s.db.Select("sequence", "hash").Where("sequence = ?", from-1).First(&prev).Error; err == nil {
+			prevHash = prev.Hash
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			problem(from-1, model.AuditChainGap, "record %d before the range is missing", from-1)
+		} else {
+			return nil, err
+		}
+	}
+	for head != nil && expected <= to {
+		var records []model.AuditLog
+		err := s.db.Where("sequence >= ? AND sequence <= ?", expected, to).Order("sequence").Limit(auditChainBatch).Find(&records).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to load audit records: %w", err)
+		}
+		if len(records) == 0 {
+			problem(expected, model.AuditChainGap, "records %d to %d are missing", expected, to)
+			break
+		}
+		for i := range records {
+			record := &records[i]
+			sequence := *record.Sequence
+			if sequence != expected {
+				problem(expected, model.AuditChainGap, "records %d to %d are missing", expected, sequence-1)
+				prevHash = "" // The missing record's hash is unknown, so the next link cannot be checked
+			}
+			if prevHash != "" && record.PrevHash != prevHash {
+				problem(sequence, model.AuditChainBreak, "record %d does not follow record %d", sequence, sequence-1)
+			}
+			if auditRecordHash(record, sequence, record.PrevHash) != record.Hash {
+				problem(sequence, model.AuditChainHashMismatch, "record %d (%s) changed after it was sealed", sequence, record.ID)
+			}
+			prevHash = record.Hash
+			expected = sequence + 1
+			result.Checked++
+		}
+		if err := s.verifyCheckpoints(records[0].Sequence, records[len(records)-1].Sequence, records, result, problem); err != nil {
+			return nil, err
+		}
+	}
+
+	// A checkpoint past the chain's end means its newest records were deleted
+	var beyond []model.AuditCheckpoint
+	last := int64(0)
+	if head != nil {
+		last = *head.Sequence
+	}
+	if err := s.db.Where("sequence > ?", last).Order("sequence").Find(&beyond).Error; err != nil {
+		return nil, err
+	}
+	for i := range beyond {
+		result.Checkpoints++
+		problem(beyond[i].Sequence, model.AuditChainCheckpointMismatch, "checkpoint %d is past the end of the chain at %d", beyond[i].Sequence, last)
+	}
+
+	result.Valid = len(result.Problems) == 0
+	return result, nil
+}
+
+// verifyCheckpoints checks the checkpoints within a batch of records against them
+func (s *AuditChainService) verifyCheckpoints(first, last *int64, records []model.AuditLog, result *model.AuditChainVerification, problem func(int64, string, string, ...interface{})) error {
+	var checkpoints []model.AuditCheckpoint
+	if err := s.db.Where("sequence >= ? AND sequence <= ?", *first, *last).Order("sequence").Find(&checkpoints).Error; err != nil {
+		return err
+	}
+	bySequence := make(map[int64]*model.AuditLog, len(records))
+	for i := range records {
+		bySequence[*records[i].Sequence] = &records[i]
+	}
+	for i := range checkpoints {
+		result.Checkpoints++
+		record, ok := bySequence[checkpoints[i].Sequence]
+		switch {
+		case !ok:
+			problem(checkpoints[i].Sequence, model.AuditChainCheckpointMismatch, "record %d of checkpoint %s is missing", checkpoints[i].Sequence, checkpoints[i].ID)
+		case record.Hash != checkpoints[i].Hash:
+			problem(checkpoints[i].Sequence, model.AuditChainCheckpointMismatch, "record %d no longer matches checkpoint %s", checkpoints[i].Sequence, checkpoints[i].ID)
+		}
+	}
+	return nil
+}
@@ -41,6 +41,10 @@ type LoginResponse struct {
 	RefreshToken string       `json:"refreshToken"`
 	ExpiresIn    int          `json:"expiresIn"`
 	User         *UserResponse `json:"user"`
+	// Set instead of the tokens when the login must be completed with a second
+	// factor at /api/v1/auth/mfa/verify
+	MFARequired bool   `json:"mfaRequired,omitempty"`
+	MFAToken    string `json:"mfaToken,omitempty"`
 }
 
 // LDAPLoginRequest represents an LDAP login request
@@ -61,6 +65,14 @@ type RefreshTokenResponse struct {
 	ExpiresIn    int    `json:"expiresIn"`
 }
 
+// AuthProvidersResponse lists the login methods currently offered
+type AuthProvidersResponse struct {
+	Local        bool   `json:"local"`
+	LDAP         bool   `json:"ldap"`
+	OIDC         bool   `json:"oidc"`
+	OIDCLoginURL string `json:"oidcLoginUrl,omitempty"`
+}
+
 // UserResponse represents user information in responses
 type UserResponse struct {
 	ID       string `json:"id"`
@@ -74,6 +86,8 @@ type AuthService struct {
 	jwtManager *jwt.Manager
 	tokenRepo  *redis.RefreshTokenRepository
 	ldapClient *ldapauth.Client
+	sso        *SSOService
+	accounts   *AccountService
 }
 
 // NewAuthService creates a new AuthService
@@ -86,6 +100,31 @@ func NewAuthService(userRepo *db.UserRepository, jwtManager *jwt.Manager, tokenR
 	}
 }
 
+// SetSSO makes LDAP login use the LDAP settings instead of the client given at
+// construction, and sync the roles of LDAP users from their groups
+func (s *AuthService) SetSSO(sso *SSOService) {
+	s.sso = sso
+}
+
+// SetAccounts enables account lockout after failed password logins and the MFA
+// challenge for users who enabled MFA
+func (s *AuthService) SetAccounts(accounts *AccountService) {
+	s.accounts = accounts
+}
+
+// Providers returns the login methods currently offered
+func (s *AuthService) Providers() *AuthProvidersResponse {
+	resp := &AuthProvidersResponse{
+		Local: true,
+		LDAP:  s.currentLDAPClient() != nil,
+		OIDC:  s.sso.OIDCEnabled(),
+	}
+	if resp.OIDC {
+		resp.OIDCLoginURL = "/api/v1/auth/oidc/login"
+	}
+	return resp
+}
+
 // Register handles user registration
 func (s *AuthService) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
 	// 1. Validate input
@@ -156,57 +195,103 @@ func (s *AuthService) Login(ctx context.Context, req *LoginRequest) (*LoginRespo
 		return nil, err
 	}
 
-	// 2. Verify password (return same error whether user not found or password wrong)
-	if user == nil || !auth.ComparePassword(user.PasswordHash, req.Password) {
+	if user == nil {
 		return nil, apperrors.ErrInvalidCredentials
 	}
 
-	// 3. Generate Access Token
-	accessToken, err := s.jwtManager.GenerateAccessToken(user.ID.String(), user.Username)
-	if err != nil {
-		return nil, err
+	// 2. Refuse locked accounts before checking the password
+	if s.accounts != nil {
+		if err := s.accounts.CheckLocked(user); err != nil {
+			return nil, err
+		}
 	}
 
-	// 4. Generate Refresh Token
-	refreshToken, err := s.jwtManager.GenerateRefreshToken(user.ID.String())
-	if err != nil {
-		return nil, err
+	// 3. Verify password (return same error whether user not found or password wrong)
+	if !auth.ComparePassword(user.PasswordHash, req.Password) {
+		if s.accounts != nil {
+			locked, err := s.accounts.RecordFailedLogin(user)
+			if err != nil {
+				return nil, err
+			}
+			if locked {
+				return nil, apperrors.ErrAccountLocked
+			}
+		}
+		return nil, apperrors.ErrInvalidCredentials
+	}
+	if !user.IsActive {
+		return nil, apperrors.ErrUserDisabled
+	}
+	if s.accounts != nil {
+		if err := s.accounts.ResetFailedLogins(user); err != nil {
+			return nil, err
+		}
 	}
 
-	// 5. Validate Refresh Token to get tokenID
-	tokenID, userID, err := s.jwtManager.ValidateRefreshToken(refreshToken)
+	// 4. Issue tokens, or an MFA challenge
+	return s.completeLogin(ctx, user, user.Username)
+}
+
+// VerifyMFA completes a login that required a second factor
+func (s *AuthService) VerifyMFA(ctx context.Context, req *model.MFAVerifyRequest) (*LoginResponse, error) {
+	if s.accounts == nil {
+		return nil, apperrors.ErrInvalidMFACode
+	}
+	user, err := s.accounts.CompleteMFAChallenge(req.MFAToken, req.Code)
 	if err != nil {
 		return nil, err
 	}
+	if !user.IsActive {
+		return nil, apperrors.ErrUserDisabled
+	}
+	return s.IssueTokens(ctx, user, user.Username)
+}
 
-	// 6. Store Refresh Token in Redis (30 days)
-	err = s.tokenRepo.Store(ctx, userID, tokenID, 30*24*time.Hour)
-	if err != nil {
-		return nil, err
+// RevokeRefreshToken signs a user out of every session that relies on its refresh token
+func (s *AuthService) RevokeRefreshToken(ctx context.Context, userID uuid.UUID) error {
+	if s.tokenRepo == nil {
+		return nil
 	}
+	return s.tokenRepo.Delete(ctx, userID.String())
+}
 
-	// 7. Return response
-	return &LoginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    3600, // 1 hour
-		User: &UserResponse{
-			ID:       user.ID.String(),
-			Username: user.Username,
-			Email:    user.Email,
-		},
-	}, nil
+// completeLogin issues tokens for a user who passed the first factor, or an MFA
+// challenge if the user enabled MFA
+func (s *AuthService) completeLogin(ctx context.Context, user *model.User, displayName string) (*LoginResponse, error) {
+	if s.accounts != nil {
+		enabled, err := s.accounts.MFAEnabled(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if enabled {
+			token, err := s.accounts.BeginMFAChallenge(user.ID)
+			if err != nil {
+				return nil, err
+			}
+			return &LoginResponse{
+				MFARequired: true,
+				MFAToken:    token,
+				User: &UserResponse{
+					ID:       user.ID.String(),
+					Username: user.Username,
+					Email:    user.Email,
+				},
+			}, nil
+		}
+	}
+	return s.IssueTokens(ctx, user, displayName)
 }
 
 // LDAPLogin handles LDAP user authentication and login
 func (s *AuthService) LDAPLogin(ctx context.Context, req *LDAPLoginRequest) (*LoginResponse, error) {
 	// 1. Check LDAP client is available
-	if s.ldapClient == nil {
+	ldapClient := s.currentLDAPClient()
+	if ldapClient == nil {
 		return nil, apperrors.NewError("LDAP_NOT_CONFIGURED", "LDAP authentication is not configured")
 	}
 
 	// 2. Authenticate with LDAP
-	ldapEntry, err := s.ldapClient.Authenticate(req.Username, req.Password)
+	ldapEntry, err := ldapClient.Authenticate(req.Username, req.Password)
 	if err != nil {
 		return nil, apperrors.Wrap("LDAP_AUTH_FAILED", "LDAP authentication failed: "+err.Error(), err)
 	}
@@ -243,6 +328,9 @@ func (s *AuthService) LDAPLogin(ctx context.Context, req *LDAPLoginRequest) (*Lo
 			return nil, err
 		}
 	} else {
+		if !user.IsActive {
+			return nil, apperrors.ErrUserDisabled
+		}
 		// Update existing LDAP user email if changed
 		if user.Email != ldapEmail {
 			user.Email = ldapEmail
@@ -252,35 +340,50 @@ func (s *AuthService) LDAPLogin(ctx context.Context, req *LDAPLoginRequest) (*Lo
 		}
 	}
 
-	// 6. Generate Access Token
+	// 6. Sync roles from LDAP groups
+	if s.sso != nil {
+		groups := ldapauth.GetUserAttributeValues(ldapEntry, s.sso.LDAPGroupAttribute())
+		if err := s.sso.SyncGroupRoles(user.ID, groups); err != nil {
+			return nil, err
+		}
+	}
+
+	// 7. Issue tokens, or an MFA challenge
 	displayName := ldapDisplayName
 	if displayName == "" {
 		displayName = ldapUsername
 	}
+	return s.completeLogin(ctx, user, displayName)
+}
+
+// IssueTokens issues an access and refresh token pair for a user authenticated
+// elsewhere, such as through LDAP or an OIDC provider
+func (s *AuthService) IssueTokens(ctx context.Context, user *model.User, displayName string) (*LoginResponse, error) {
+	// 1. Generate Access Token
 	accessToken, err := s.jwtManager.GenerateAccessToken(user.ID.String(), displayName)
 	if err != nil {
 		return nil, err
 	}
 
-	// 7. Generate Refresh Token
+	// 2. Generate Refresh Token
 	refreshToken, err := s.jwtManager.GenerateRefreshToken(user.ID.String())
 	if err != nil {
 		return nil, err
 	}
 
-	// 8. Validate Refresh Token to get tokenID
+	// 3. Validate Refresh Token to get tokenID
 	tokenID, userID, err := s.jwtManager.ValidateRefreshToken(refreshToken)
 	if err != nil {
 		return nil, err
 	}
 
-	// 9. Store Refresh Token in Redis (30 days)
+	// 4. Store Refresh Token in Redis (30 days)
 	err = s.tokenRepo.Store(ctx, userID, tokenID, 30*24*time.Hour)
 	if err != nil {
 		return nil, err
 	}
 
-	// 10. Return response
+	// 5. Return response
 	return &LoginResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
@@ -293,6 +396,15 @@ func (s *AuthService) LDAPLogin(ctx context.Context, req *LDAPLoginRequest) (*Lo
 	}, nil
 }
 
+// currentLDAPClient returns the LDAP client to authenticate with, or nil if LDAP
+// login is not available
+func (s *AuthService) currentLDAPClient() *ldapauth.Client {
+	if s.sso != nil {
+		return s.sso.LDAPClient()
+	}
+	return s.ldapClient
+}
+
 // RefreshToken handles token refresh
 func (s *AuthService) RefreshToken(ctx context.Context, req *RefreshTokenRequest) (*RefreshTokenResponse, error) {
 	// 1. Validate Refresh Token
@@ -320,6 +432,9 @@ func (s *AuthService) RefreshToken(ctx context.Context, req *RefreshTokenRequest
 	if err != nil {
 		return nil, err
 	}
+	if !user.IsActive {
+		return nil, apperrors.ErrUserDisabled
+	}
 
 	// 4. Generate new Access Token
 	accessToken, err := s.jwtManager.GenerateAccessToken(user.ID.String(), user.Username)
@@ -0,0 +1,813 @@
+// Package service provides backups of the platform database and configuration
+package service
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// backupTimeout bounds one backup, from dump to upload
+	backupTimeout = time.Hour
+	// backupScheduleInterval is how often due targets are looked for
+	backupScheduleInterval = time.Minute
+	// minBackupInterval is the shortest schedule interval, in seconds
+	minBackupInterval = 900
+)
+
+// Files of a backup archive
+const (
+	backupManifestFile = "manifest.json"
+	backupDumpFile     = "database.dump"
+	backupSettingsFile = "config/settings.json"
+	backupFlagsFile    = "config/feature_flags.json"
+	backupGatewayFile  = "config/gateway.yaml"
+)
+
+var (
+	// ErrInvalidBackupTarget is returned when a target's configuration is malformed
+	ErrInvalidBackupTarget = errors.New("invalid backup target")
+	// ErrBackupTargetNotFound is returned when the target does not exist
+	ErrBackupTargetNotFound = errors.New("backup target not found")
+	// ErrBackupNotFound is returned when the backup does not exist
+	ErrBackupNotFound = errors.New("backup not found")
+	// ErrBackupInProgress is returned when the target is already being backed up
+	ErrBackupInProgress = errors.New("a backup of this target is already running")
+)
+
+// BackupOptions is how backups reach the platform database and what they bundle
+type BackupOptions struct {
+	DBHost     string
+	DBPort     int
+	DBUser     string
+	DBPassword string
+	DBName     string
+
+	PgDump    string // pg_dump binary
+	PgRestore string // pg_restore binary
+	TempDir   string // Where archives are assembled; the system default when empty
+
+	MigrationsDir string // Newest migration of this build, checked before restoring
+	ConfigPath    string // Gateway config file added to the configuration bundle
+}
+
+// pgEnv returns the environment pg_dump and pg_restore connect with
+func (o *BackupOptions) pgEnv() []string {
+	return append(os.Environ(),
+		"PGHOST="+o.DBHost,
+		"PGPORT="+strconv.Itoa(o.DBPort),
+		"PGUSER="+o.DBUser,
+		"PGPASSWORD="+o.DBPassword,
+		"PGDATABASE="+o.DBName,
+	)
+}
+
+// BackupService writes scheduled and requested backups of the platform database
+// and configuration to storage targets, and prunes them by each target's retention
+type BackupService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	settings *SettingsService
+	opts     BackupOptions
+}
+
+// NewBackupService creates a new backup service
+func NewBackupService(db *gorm.DB, logger *zap.Logger, settings *SettingsService, opts BackupOptions) *BackupService {
+	if opts.PgDump == "" {
+		opts.PgDump = "pg_dump"
+	}
+	if opts.PgRestore == "" {
+		opts.PgRestore = "pg_restore"
+	}
+	return &BackupService{db: db, logger: logger, settings: settings, opts: opts}
+}
+
+// ============== Targets ==============
+
+// ListTargets lists the backup targets
+func (s *BackupService) ListTargets() ([]model.BackupTarget, error) {
+	var targets []model.BackupTarget
+	err := s.db.Order("name").Find(&targets).Error
+	return targets, err
+}
+
+// GetTarget gets a backup target
+func (s *BackupService) GetTarget(id uuid.UUID) (*model.BackupTarget, error) {
+	var target model.BackupTarget
+	if err := s.db.First(&target, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBackupTargetNotFound
+		}
+		return nil, err
+	}
+	return &target, nil
+}
+
+// CreateTarget adds a target whose first scheduled backup runs one interval from now
+func (s *BackupService) CreateTarget(userID uuid.UUID, req *model.CreateBackupTargetRequest) (*model.BackupTarget, error) {
+	target := &model.BackupTarget{
+		CreatedBy:       userID,
+		Name:            strings.TrimSpace(req.Name),
+		Type:            req.Type,
+		Enabled:         req.Enabled == nil || *req.Enabled,
+		Path:            strings.TrimSpace(req.Path),
+		Bucket:          strings.TrimSpace(req.Bucket),
+		Prefix:          strings.Trim(req.Prefix, "/"),
+		Region:          strings.TrimSpace(req.Region),
+		Endpoint:        strings.TrimSpace(req.Endpoint),
+		AccessKeyID:     req.AccessKeyID,
+		SecretAccessKey: req.SecretAccessKey,
+		Interval:        86400,
+		KeepLast:        7,
+		RetentionDays:   req.RetentionDays,
+	}
+	if req.Interval != nil {
+		target.Interval = *req.Interval
+	}
+	if req.KeepLast != nil {
+		target.KeepLast = *req.KeepLast
+	}
+	scheduleBackupTarget(target, time.Now())
+	if err := validateBackupTarget(target); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(target).Error; err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// UpdateTarget changes the given fields of a target. A new interval counts from now.
+func (s *BackupService) UpdateTarget(id uuid.UUID, req *model.UpdateBackupTargetRequest) (*model.BackupTarget, error) {
+	target, err := s.GetTarget(id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		target.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Enabled != nil {
+		target.Enabled = *req.Enabled
+	}
+	if req.Path != nil {
+		target.Path = strings.TrimSpace(*req.Path)
+	}
+	if req.Bucket != nil {
+		target.Bucket = strings.TrimSpace(*req.Bucket)
+	}
+	if req.Prefix != nil {
+		target.Prefix = strings.Trim(*req.Prefix, "/")
+	}
+	if req.Region != nil {
+		target.Region = strings.TrimSpace(*req.Region)
+	}
+	if req.Endpoint != nil {
+		target.Endpoint = strings.TrimSpace(*req.Endpoint)
+	}
+	if req.AccessKeyID != nil {
+		target.AccessKeyID = *req.AccessKeyID
+	}
+	if req.SecretAccessKey != nil {
+		target.SecretAccessKey = *req.SecretAccessKey
+	}
+	if req.Interval != nil {
+		target.Interval = *req.Interval
+		scheduleBackupTarget(target, time.Now())
+	}
+	if req.KeepLast != nil {
+		target.KeepLast = *req.KeepLast
+	}
+	if req.RetentionDays != nil {
+		target.RetentionDays = *req.RetentionDays
+	}
+	if err := validateBackupTarget(target); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(target).Error; err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// DeleteTarget removes a target and the records of its backups. The archives
+// themselves are left in storage.
+func (s *BackupService) DeleteTarget(id uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&model.BackupTarget{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrBackupTargetNotFound
+		}
+		return tx.Delete(&model.Backup{}, "target_id = ?", id).Error
+	})
+}
+
+// TestTarget writes, reads back and deletes a small object in the target
+func (s *BackupService) TestTarget(ctx context.Context, id uuid.UUID) error {
+	target, err := s.GetTarget(id)
+	if err != nil {
+		return err
+	}
+	storage, err := NewBackupStorage(target)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("myops-backup-test-%d", time.Now().UnixNano())
+	content := "myops backup target test"
+	if err := storage.Put(ctx, key, strings.NewReader(content), int64(len(content))); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	defer storage.Delete(context.Background(), key)
+
+	r, err := storage.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("read failed: %w", err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, int64(len(content))+1))
+	if err != nil {
+		return fmt.Errorf("read failed: %w", err)
+	}
+	if string(data) != content {
+		return errors.New("read back different content than was written")
+	}
+	return nil
+}
+
+// scheduleBackupTarget sets when the target is next backed up
+func scheduleBackupTarget(target *model.BackupTarget, from time.Time) {
+	target.NextRunAt = nil
+	if target.Interval > 0 {
+		next := from.Add(time.Duration(target.Interval) * time.Second)
+		target.NextRunAt = &next
+	}
+}
+
+func validateBackupTarget(target *model.BackupTarget) error {
+	if target.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidBackupTarget)
+	}
+	switch target.Type {
+	case model.BackupStorageLocal:
+		if !filepath.IsAbs(target.Path) {
+			return fmt.Errorf("%w: path must be absolute", ErrInvalidBackupTarget)
+		}
+	case model.BackupStorageS3:
+		if target.Bucket == "" || target.Region == "" {
+			return fmt.Errorf("%w: bucket and region are required", ErrInvalidBackupTarget)
+		}
+		if target.AccessKeyID == "" || target.SecretAccessKey == "" {
+			return fmt.Errorf("%w: accessKeyId and secretAccessKey are required", ErrInvalidBackupTarget)
+		}
+	default:
+		return fmt.Errorf("%w: type must be local or s3", ErrInvalidBackupTarget)
+	}
+	if target.Interval != 0 && target.Interval < minBackupInterval {
+		return fmt.Errorf("%w: interval must be 0 or at least %d seconds", ErrInvalidBackupTarget, minBackupInterval)
+	}
+	if target.KeepLast < 0 || target.RetentionDays < 0 {
+		return fmt.Errorf("%w: keepLast and retentionDays cannot be negative", ErrInvalidBackupTarget)
+	}
+	return nil
+}
+
+// ============== Backups ==============
+
+// List lists backups, most recent first, with the total matching the filter
+func (s *BackupService) List(filter *model.BackupFilter) ([]model.Backup, int64, error) {
+	query := s.db.Model(&model.Backup{})
+	if filter.TargetID != nil {
+		query = query.Where("target_id = ?", *filter.TargetID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	var backups []model.Backup
+	if err := query.Order("created_at DESC").Limit(limit).Offset(filter.Offset).Find(&backups).Error; err != nil {
+		return nil, 0, err
+	}
+	return backups, total, nil
+}
+
+// Get gets a backup
+func (s *BackupService) Get(id uuid.UUID) (*model.Backup, error) {
+	var backup model.Backup
+	if err := s.db.First(&backup, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBackupNotFound
+		}
+		return nil, err
+	}
+	return &backup, nil
+}
+
+// Open opens the archive of a completed backup for download
+func (s *BackupService) Open(ctx context.Context, id uuid.UUID) (*model.Backup, io.ReadCloser, error) {
+	backup, err := s.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if backup.Status != model.BackupCompleted {
+		return nil, nil, ErrBackupNotFound
+	}
+	target, err := s.GetTarget(backup.TargetID)
+	if err != nil {
+		return nil, nil, err
+	}
+	storage, err := NewBackupStorage(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := storage.Get(ctx, backup.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return backup, r, nil
+}
+
+// Delete removes a backup's archive and its record
+func (s *BackupService) Delete(ctx context.Context, id uuid.UUID) error {
+	backup, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if backup.Status == model.BackupRunning {
+		return ErrBackupInProgress
+	}
+	if err := s.deleteArchive(ctx, backup); err != nil {
+		return err
+	}
+	return s.db.Delete(backup).Error
+}
+
+func (s *BackupService) deleteArchive(ctx context.Context, backup *model.Backup) error {
+	if backup.Key == "" {
+		return nil
+	}
+	target, err := s.GetTarget(backup.TargetID)
+	if err != nil {
+		return err
+	}
+	storage, err := NewBackupStorage(target)
+	if err != nil {
+		return err
+	}
+	return storage.Delete(ctx, backup.Key)
+}
+
+// Start begins a backup of the platform to the target and returns its record
+// while it runs. Its status, and any error, are recorded on the backup.
+func (s *BackupService) Start(targetID uuid.UUID, userID *uuid.UUID) (*model.Backup, error) {
+	target, err := s.GetTarget(targetID)
+	if err != nil {
+		return nil, err
+	}
+	trigger := model.BackupTriggerScheduled
+	if userID != nil {
+		trigger = model.BackupTriggerManual
+	}
+	backup, err := s.begin(target, trigger, userID)
+	if err != nil {
+		return nil, err
+	}
+	go s.run(target, backup)
+	return backup, nil
+}
+
+// begin records a running backup unless the target already has one
+func (s *BackupService) begin(target *model.BackupTarget, trigger string, userID *uuid.UUID) (*model.Backup, error) {
+	backup := &model.Backup{
+		ID:          uuid.New(),
+		TargetID:    target.ID,
+		TargetName:  target.Name,
+		Status:      model.BackupRunning,
+		Trigger:     trigger,
+		TriggeredBy: userID,
+		StartedAt:   time.Now(),
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var running int64
+		if err := tx.Model(&model.Backup{}).Where("target_id = ? AND status = ?", target.ID, model.BackupRunning).Count(&running).Error; err != nil {
+			return err
+		}
+		if running > 0 {
+			return ErrBackupInProgress
+		}
+		return tx.Create(backup).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// run writes the backup and records how it ended
+func (s *BackupService) run(target *model.BackupTarget, backup *model.Backup) {
+	ctx, cancel := context.WithTimeout(context.Background(), backupTimeout)
+	defer cancel()
+
+	err := s.write(ctx, target, backup)
+	now := time.Now()
+	backup.CompletedAt = &now
+	if err != nil {
+		backup.Status = model.BackupFailed
+		backup.Error = err.Error()
+		s.logger.Error("backup failed", zap.String("target", target.Name), zap.Error(err))
+	} else {
+		backup.Status = model.BackupCompleted
+		s.logger.Info("backup completed", zap.String("target", target.Name),
+			zap.String("key", backup.Key), zap.Int64("size", backup.Size))
+	}
+	if err := s.db.Save(backup).Error; err != nil {
+		s.logger.Error("failed to record backup", zap.String("target", target.Name), zap.Error(err))
+		return
+	}
+	if err == nil {
+		if deleted, err := s.prune(ctx, target); err != nil {
+			s.logger.Error("failed to prune backups", zap.String("target", target.Name), zap.Error(err))
+		} else if deleted > 0 {
+			s.logger.Info("pruned backups", zap.String("target", target.Name), zap.Int("deleted", deleted))
+		}
+	}
+}
+
+// write assembles the archive in a temporary directory and uploads it
+func (s *BackupService) write(ctx context.Context, target *model.BackupTarget, backup *model.Backup) error {
+	storage, err := NewBackupStorage(target)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp(s.opts.TempDir, "myops-backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	archive, manifest, err := s.assemble(ctx, dir)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	info, err := archive.Stat()
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, archive); err != nil {
+		return err
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("myops-backup-%s.tar", manifest.CreatedAt.UTC().Format("20060102-150405"))
+	if err := storage.Put(ctx, key, archive, info.Size()); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	backup.Key = key
+	backup.Size = info.Size()
+	backup.Checksum = hex.EncodeToString(hash.Sum(nil))
+	backup.SchemaVersion = manifest.SchemaVersion
+	return nil
+}
+
+// assemble dumps the database and writes the archive: the manifest, the dump and
+// the configuration bundle
+func (s *BackupService) assemble(ctx context.Context, dir string) (*os.File, *model.BackupManifest, error) {
+	manifest := &model.BackupManifest{
+		FormatVersion: model.BackupFormatVersion,
+		CreatedAt:     time.Now(),
+		Database:      s.opts.DBName,
+	}
+	var err error
+	if manifest.SchemaVersion, err = appliedSchemaVersion(ctx, s.db); err != nil {
+		return nil, nil, err
+	}
+	s.db.WithContext(ctx).Raw("SHOW server_version").Row().Scan(&manifest.PostgresVersion)
+
+	dumpPath := filepath.Join(dir, backupDumpFile)
+	cmd := exec.CommandContext(ctx, s.opts.PgDump, "--format=custom", "--no-owner", "--no-privileges", "--file", dumpPath)
+	cmd.Env = s.opts.pgEnv()
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, nil, fmt.Errorf("pg_dump failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	if manifest.DumpChecksum, err = fileChecksum(dumpPath); err != nil {
+		return nil, nil, err
+	}
+
+	bundle, err := s.configBundle()
+	if err != nil {
+		return nil, nil, err
+	}
+	names := make([]string, 0, len(bundle))
+	for name := range bundle {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	manifest.Files = append([]string{backupDumpFile}, names...)
+
+	archive, err := os.Create(filepath.Join(dir, "backup.tar"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeBackupArchive(archive, manifest, dumpPath, bundle); err != nil {
+		archive.Close()
+		return nil, nil, err
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		archive.Close()
+		return nil, nil, err
+	}
+	return archive, manifest, nil
+}
+
+// configBundle exports the runtime settings, with secrets masked, the feature
+// flags and the gateway config file. They are restored with the database; the
+// bundle is for reading and for rebuilding a gateway's config.
+func (s *BackupService) configBundle() (map[string][]byte, error) {
+	bundle := make(map[string][]byte)
+	if s.settings != nil {
+		data, err := json.MarshalIndent(s.settings.List(""), "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		bundle[backupSettingsFile] = data
+	}
+
+	var flags []model.FeatureFlag
+	if err := s.db.Order("key").Find(&flags).Error; err != nil {
+		return nil, fmt.Errorf("failed to export feature flags: %w", err)
+	}
+	data, err := json.MarshalIndent(flags, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	bundle[backupFlagsFile] = data
+
+	if s.opts.ConfigPath != "" {
+		data, err := os.ReadFile(s.opts.ConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gateway config: %w", err)
+		}
+		bundle[backupGatewayFile] = data
+	}
+	return bundle, nil
+}
+
+func writeBackupArchive(w io.Writer, manifest *model.BackupManifest, dumpPath string, bundle map[string][]byte) error {
+	tw := tar.NewWriter(w)
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, backupManifestFile, manifestData, manifest.CreatedAt); err != nil {
+		return err
+	}
+
+	dump, err := os.Open(dumpPath)
+	if err != nil {
+		return err
+	}
+	defer dump.Close()
+	info, err := dump.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: backupDumpFile, Mode: 0600, Size: info.Size(), ModTime: manifest.CreatedAt}); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, dump); err != nil {
+		return err
+	}
+
+	for _, name := range manifest.Files[1:] {
+		if err := writeTarFile(tw, name, bundle[name], manifest.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func fileChecksum(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// appliedSchemaVersion reads the schema version recorded by golang-migrate
+func appliedSchemaVersion(ctx context.Context, db *gorm.DB) (uint64, error) {
+	var (
+		version uint64
+		dirty   bool
+	)
+	if err := db.WithContext(ctx).Raw("SELECT version, dirty FROM schema_migrations LIMIT 1").Row().Scan(&version, &dirty); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if dirty {
+		return version, fmt.Errorf("migration %d is dirty", version)
+	}
+	return version, nil
+}
+
+// ============== Status ==============
+
+// Overview reports for each target when it last backed up and whether its
+// backups are overdue: no completed backup within twice its interval
+func (s *BackupService) Overview() (*model.BackupOverview, error) {
+	targets, err := s.ListTargets()
+	if err != nil {
+		return nil, err
+	}
+
+	overview := &model.BackupOverview{Healthy: true, Targets: make([]model.BackupTargetHealth, 0, len(targets))}
+	for i := range targets {
+		target := &targets[i]
+		health := model.BackupTargetHealth{
+			TargetID:   target.ID,
+			TargetName: target.Name,
+			Enabled:    target.Enabled,
+			Interval:   target.Interval,
+			NextRunAt:  target.NextRunAt,
+		}
+
+		var last model.Backup
+		if err := s.db.Where("target_id = ? AND status = ?", target.ID, model.BackupCompleted).Order("created_at DESC").First(&last).Error; err == nil {
+			health.LastSuccess = &last
+		}
+		var failure model.Backup
+		if err := s.db.Where("target_id = ? AND status = ?", target.ID, model.BackupFailed).Order("created_at DESC").First(&failure).Error; err == nil {
+			health.LastFailure = &failure
+		}
+		var totals struct {
+			Count int64
+			Size  int64
+		}
+		s.db.Model(&model.Backup{}).Select("COUNT(*) AS count, COALESCE(SUM(size), 0) AS size").
+			Where("target_id = ? AND status = ?", target.ID, model.BackupCompleted).Scan(&totals)
+		health.Backups, health.TotalSize = totals.Count, totals.Size
+		var running int64
+		s.db.Model(&model.Backup{}).Where("target_id = ? AND status = ?", target.ID, model.BackupRunning).Count(&running)
+		health.Running = running > 0
+
+		if target.Enabled && target.Interval > 0 {
+			window := 2 * time.Duration(target.Interval) * time.Second
+			switch {
+			case health.LastSuccess == nil && time.Since(target.CreatedAt) > window:
+				health.Overdue, health.OverdueReason = true, "No backup has completed"
+			case health.LastSuccess != nil && time.Since(health.LastSuccess.CreatedAt) > window:
+				health.Overdue, health.OverdueReason = true, fmt.Sprintf("Last backup completed %s ago", time.Since(health.LastSuccess.CreatedAt).Round(time.Minute))
+			}
+			if health.Overdue {
+				overview.Healthy = false
+			}
+		}
+		overview.Targets = append(overview.Targets, health)
+	}
+	return overview, nil
+}
+
+// ============== Scheduled Backups ==============
+
+// Run backs up due targets every minute until ctx is done. Backups left running
+// by a previous gateway are marked failed first.
+func (s *BackupService) Run(ctx context.Context) {
+	if err := s.Recover(); err != nil {
+		s.logger.Error("failed to mark interrupted backups", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(backupScheduleInterval)
+	defer ticker.Stop()
+	for {
+		s.runDue()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Recover marks backups that have been running longer than a backup may take as failed
+func (s *BackupService) Recover() error {
+	return s.db.Model(&model.Backup{}).
+		Where("status = ? AND started_at < ?", model.BackupRunning, time.Now().Add(-backupTimeout)).
+		Updates(map[string]interface{}{
+			"status":       model.BackupFailed,
+			"error":        "backup was interrupted",
+			"completed_at": time.Now(),
+		}).Error
+}
+
+// runDue starts a backup of every enabled target whose next run has come. A
+// target is claimed by moving its next run, so each run happens once even with
+// several gateway replicas.
+func (s *BackupService) runDue() {
+	var due []model.BackupTarget
+	if err := s.db.Where("enabled = ? AND interval > 0 AND next_run_at <= ?", true, time.Now()).Find(&due).Error; err != nil {
+		s.logger.Error("failed to load backup targets", zap.Error(err))
+		return
+	}
+
+	for i := range due {
+		target := &due[i]
+		previous := *target.NextRunAt
+		scheduleBackupTarget(target, time.Now())
+		claim := s.db.Model(&model.BackupTarget{}).
+			Where("id = ? AND next_run_at = ?", target.ID, previous).
+			Update("next_run_at", target.NextRunAt)
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+
+		backup, err := s.begin(target, model.BackupTriggerScheduled, nil)
+		if err != nil {
+			if !errors.Is(err, ErrBackupInProgress) {
+				s.logger.Error("failed to start scheduled backup", zap.String("target", target.Name), zap.Error(err))
+			}
+			continue
+		}
+		go s.run(target, backup)
+	}
+}
+
+// prune deletes the target's completed backups beyond KeepLast and older than
+// RetentionDays. The newest completed backup is always kept.
+func (s *BackupService) prune(ctx context.Context, target *model.BackupTarget) (int, error) {
+	var completed []model.Backup
+	if err := s.db.Where("target_id = ? AND status = ?", target.ID, model.BackupCompleted).
+		Order("created_at DESC").Find(&completed).Error; err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for i := 1; i < len(completed); i++ {
+		backup := &completed[i]
+		expired := target.KeepLast > 0 && i >= target.KeepLast
+		if target.RetentionDays > 0 && time.Since(backup.CreatedAt) > time.Duration(target.RetentionDays)*24*time.Hour {
+			expired = true
+		}
+		if !expired {
+			continue
+		}
+		if err := s.deleteArchive(ctx, backup); err != nil {
+			return deleted, fmt.Errorf("failed to delete %s: %w", backup.Key, err)
+		}
+		if err := s.db.Delete(backup).Error; err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	// Failed backups have no archive worth keeping once a newer one completed
+	if len(completed) > 0 {
+		s.db.Where("target_id = ? AND status = ? AND created_at < ?", target.ID, model.BackupFailed, completed[0].CreatedAt).
+			Delete(&model.Backup{})
+	}
+	return deleted, nil
+}
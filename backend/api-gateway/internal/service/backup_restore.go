@@ -0,0 +1,220 @@
+// Package service provides restores of platform backups
+package service
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// ErrRestoreRefused is returned when a pre-flight check failed
+var ErrRestoreRefused = errors.New("restore refused by pre-flight checks")
+
+// RestoreCheck is the outcome of one pre-flight check. A failed check refuses the
+// restore; a forced restore goes ahead despite checks marked Forceable.
+type RestoreCheck struct {
+	Name      string `json:"name"`
+	Passed    bool   `json:"passed"`
+	Forceable bool   `json:"forceable,omitempty"`
+	Message   string `json:"message"`
+}
+
+// Restore is a backup archive unpacked and checked, ready to be applied to the
+// platform database
+type Restore struct {
+	Manifest *model.BackupManifest
+	Checks   []RestoreCheck
+
+	opts BackupOptions
+	dir  string
+}
+
+// OpenRestore unpacks the archive read from r and runs the pre-flight checks: the
+// archive is complete, its schema is not newer than this build's migrations, and
+// pg_restore can read the dump into the target server. db is the target database
+// and may be nil when it is not reachable yet.
+func OpenRestore(ctx context.Context, db *gorm.DB, opts BackupOptions, r io.Reader) (*Restore, error) {
+	if opts.PgRestore == "" {
+		opts.PgRestore = "pg_restore"
+	}
+	dir, err := os.MkdirTemp(opts.TempDir, "myops-restore-")
+	if err != nil {
+		return nil, err
+	}
+	restore := &Restore{opts: opts, dir: dir}
+	if err := restore.extract(r); err != nil {
+		restore.Close()
+		return nil, err
+	}
+	restore.check(ctx, db)
+	return restore, nil
+}
+
+// extract writes the archive's files into the restore directory
+func (r *Restore) extract(archive io.Reader) error {
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.Clean("/" + header.Name)
+		if name == "/" {
+			continue
+		}
+		out := filepath.Join(r.dir, name)
+		if err := os.MkdirAll(filepath.Dir(out), 0700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(r.dir, backupManifestFile))
+	if err != nil {
+		return errors.New("archive has no manifest; it is not a platform backup")
+	}
+	var manifest model.BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid manifest: %w", err)
+	}
+	r.Manifest = &manifest
+	return nil
+}
+
+func (r *Restore) check(ctx context.Context, db *gorm.DB) {
+	add := func(name string, passed, forceable bool, format string, args ...interface{}) {
+		r.Checks = append(r.Checks, RestoreCheck{Name: name, Passed: passed, Forceable: forceable, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if r.Manifest.FormatVersion > model.BackupFormatVersion {
+		add("format", false, false, "archive format %d is newer than this build reads (%d)", r.Manifest.FormatVersion, model.BackupFormatVersion)
+		return
+	}
+	add("format", true, false, "archive format %d, created %s", r.Manifest.FormatVersion, r.Manifest.CreatedAt.UTC().Format("2006-01-02 15:04:05 MST"))
+
+	dumpPath := filepath.Join(r.dir, backupDumpFile)
+	checksum, err := fileChecksum(dumpPath)
+	switch {
+	case err != nil:
+		add("dump", false, false, "database dump is missing")
+		return
+	case checksum != r.Manifest.DumpChecksum:
+		add("dump", false, false, "database dump checksum does not match the manifest; the archive is corrupt")
+		return
+	}
+	add("dump", true, false, "database dump checksum matches")
+
+	latest, err := latestMigrationVersion(r.opts.MigrationsDir)
+	switch {
+	case err != nil || latest == 0:
+		add("schema", false, true, "cannot read this build's migrations from %q to compare with schema version %d", r.opts.MigrationsDir, r.Manifest.SchemaVersion)
+	case r.Manifest.SchemaVersion > latest:
+		add("schema", false, true, "backup schema version %d is newer than this build's %d; restore with the release that made the backup", r.Manifest.SchemaVersion, latest)
+	case r.Manifest.SchemaVersion < latest:
+		add("schema", true, false, "backup schema version %d is older than this build's %d; run the migrations after restoring", r.Manifest.SchemaVersion, latest)
+	default:
+		add("schema", true, false, "backup schema version %d matches this build", latest)
+	}
+
+	if _, err := exec.LookPath(r.opts.PgRestore); err != nil {
+		add("pg_restore", false, false, "%s not found", r.opts.PgRestore)
+		return
+	}
+	cmd := exec.CommandContext(ctx, r.opts.PgRestore, "--list", dumpPath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		add("pg_restore", false, false, "%s cannot read the dump: %s", r.opts.PgRestore, strings.TrimSpace(string(out)))
+		return
+	}
+	add("pg_restore", true, false, "%s can read the dump", r.opts.PgRestore)
+
+	if db == nil {
+		add("database", false, false, "target database is not reachable")
+		return
+	}
+	var serverVersion string
+	if err := db.WithContext(ctx).Raw("SHOW server_version").Row().Scan(&serverVersion); err != nil {
+		add("database", false, false, "target database is not reachable: %v", err)
+		return
+	}
+	if postgresMajor(serverVersion) < postgresMajor(r.Manifest.PostgresVersion) {
+		add("database", false, true, "target server runs PostgreSQL %s, older than the backup's %s", serverVersion, r.Manifest.PostgresVersion)
+		return
+	}
+	add("database", true, false, "target server runs PostgreSQL %s; backup was taken from %s", serverVersion, r.Manifest.PostgresVersion)
+}
+
+// postgresMajor returns the major version of a server_version such as "15.4 (Debian 15.4-1)"
+func postgresMajor(version string) int {
+	version = strings.TrimSpace(version)
+	if i := strings.IndexAny(version, ". "); i >= 0 {
+		version = version[:i]
+	}
+	major, _ := strconv.Atoi(version)
+	return major
+}
+
+// Ready reports whether the checks allow the restore. force overrides the
+// checks that allow it.
+func (r *Restore) Ready(force bool) error {
+	for _, check := range r.Checks {
+		if !check.Passed && !(force && check.Forceable) {
+			return fmt.Errorf("%w: %s: %s", ErrRestoreRefused, check.Name, check.Message)
+		}
+	}
+	return nil
+}
+
+// Apply replaces the target database's objects with the backup's, in a single
+// transaction so a failed restore leaves the database as it was. The gateways
+// should be stopped first.
+func (r *Restore) Apply(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, r.opts.PgRestore,
+		"--clean", "--if-exists", "--no-owner", "--no-privileges", "--single-transaction",
+		"--dbname", r.opts.DBName, filepath.Join(r.dir, backupDumpFile))
+	cmd.Env = r.opts.pgEnv()
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("pg_restore failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// GatewayConfig returns the gateway config file bundled in the backup
+func (r *Restore) GatewayConfig() ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(r.dir, backupGatewayFile))
+	if os.IsNotExist(err) {
+		return nil, errors.New("backup does not include a gateway config")
+	}
+	return data, err
+}
+
+// Close removes the unpacked archive
+func (r *Restore) Close() error {
+	return os.RemoveAll(r.dir)
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// awsUnsignedPayload lets S3 uploads stream without hashing the body first
+const awsUnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// ErrBackupObjectExists is returned when writing once to a key already stored
+var ErrBackupObjectExists = errors.New("an object is already stored under the key")
+
+// BackupStorage stores backup archives
+type BackupStorage interface {
+	// Put stores size bytes read from r under key
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get opens the archive stored under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the archive stored under key; a missing archive is not an error
+	Delete(ctx context.Context, key string) error
+	// PutOnce stores data under key unless something is stored there already, and
+	// locks it against deletion until retainUntil where the storage supports it
+	PutOnce(ctx context.Context, key string, data []byte, retainUntil *time.Time) error
+}
+
+// NewBackupStorage creates a client for the target's storage type
+func NewBackupStorage(target *model.BackupTarget) (BackupStorage, error) {
+	switch target.Type {
+	case model.BackupStorageLocal:
+		if target.Path == "" {
+			return nil, errors.New("path is required")
+		}
+		return &localBackupStorage{dir: target.Path}, nil
+	case model.BackupStorageS3:
+		if target.Bucket == "" || target.Region == "" {
+			return nil, errors.New("bucket and region are required")
+		}
+		if target.AccessKeyID == "" || target.SecretAccessKey == "" {
+			return nil, errors.New("access key is required")
+		}
+		return &s3BackupStorage{
+			client: &http.Client{Timeout: time.Hour},
+			target: target,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported backup storage type: %s", target.Type)
+}
+
+// localBackupStorage keeps archives in a directory
+type localBackupStorage struct {
+	dir string
+}
+
+// file resolves key inside the directory, refusing keys that leave it
+func (s *localBackupStorage) file(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid backup key %q", key)
+	}
+	return filepath.Join(s.dir, clean), nil
+}
+
+func (s *localBackupStorage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	name, err := s.file(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	// Write beside the archive and rename, so a partial archive is never seen
+	tmp := name + ".partial"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (s *localBackupStorage) PutOnce(ctx context.Context, key string, data []byte, retainUntil *time.Time) error {
+	name, err := s.file(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	tmp := name + ".partial"
+	if err := os.WriteFile(tmp, data, 0400); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	defer os.Remove(tmp)
+	// Linking, unlike renaming, fails rather than replace an existing file
+	if err := os.Link(tmp, name); err != nil {
+		if os.IsExist(err) {
+			return ErrBackupObjectExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *localBackupStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.file(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(name)
+}
+
+func (s *localBackupStorage) Delete(ctx context.Context, key string) error {
+	name, err := s.file(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// s3BackupStorage keeps archives in an S3 bucket. AWS is addressed by virtual
+// host; custom endpoints, such as MinIO, by path.
+type s3BackupStorage struct {
+	client *http.Client
+	target *model.BackupTarget
+}
+
+func (s *s3BackupStorage) objectURL(key string) *url.URL {
+	object := path.Join(s.target.Prefix, key)
+	if s.target.Endpoint == "" {
+		return &url.URL{Scheme: "https", Host: s.target.Bucket + ".s3." + s.target.Region + ".amazonaws.com", Path: "/" + object}
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(s.target.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		endpoint = &url.URL{Scheme: "https", Host: s.target.Endpoint}
+	}
+	return &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host, Path: endpoint.Path + "/" + s.target.Bucket + "/" + object}
+}
+
+func (s *s3BackupStorage) do(ctx context.Context, method, key string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.ContentLength = size
+		if req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/x-tar")
+		}
+	}
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = awsUnsignedPayload
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	signAWSRequest(req, payloadHash, s.target.Region, "s3", s.target.AccessKeyID, s.target.SecretAccessKey, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 request failed: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, s3Error(resp)
+	}
+	return resp, nil
+}
+
+// s3Error describes a failed S3 response by its error code and message
+func s3Error(resp *http.Response) error {
+	// Only conditional writes fail their precondition
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return ErrBackupObjectExists
+	}
+	var result struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if xml.Unmarshal(data, &result) == nil && result.Code != "" {
+		return fmt.Errorf("S3 returned %d %s: %s", resp.StatusCode, result.Code, result.Message)
+	}
+	return fmt.Errorf("S3 returned %d", resp.StatusCode)
+}
+
+func (s *s3BackupStorage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	resp, err := s.do(ctx, http.MethodPut, key, r, size, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3BackupStorage) PutOnce(ctx context.Context, key string, data []byte, retainUntil *time.Time) error {
+	sum := md5.Sum(data)
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Md5", base64.StdEncoding.EncodeToString(sum[:]))
+	header.Set("If-None-Match", "*")
+	header.Set("X-Amz-Content-Sha256", sha256Hex(data))
+	if retainUntil != nil {
+		header.Set("X-Amz-Object-Lock-Mode", "COMPLIANCE")
+		header.Set("X-Amz-Object-Lock-Retain-Until-Date", retainUntil.UTC().Format(time.RFC3339))
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, bytes.NewReader(data), int64(len(data)), header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3BackupStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *s3BackupStorage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -3,6 +3,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -16,8 +17,9 @@ import (
 
 // BatchTaskExecutor handles execution of batch tasks across multiple hosts
 type BatchTaskExecutor struct {
-	db     *gorm.DB
-	logger *zap.Logger
+	db       *gorm.DB
+	logger   *zap.Logger
+	events   *EventBus
 }
 
 // NewBatchTaskExecutor creates a new batch task executor
@@ -28,6 +30,11 @@ func NewBatchTaskExecutor(db *gorm.DB, logger *zap.Logger) *BatchTaskExecutor {
 	}
 }
 
+// SetEventBus sets the bus task progress and completion events are published on
+func (e *BatchTaskExecutor) SetEventBus(events *EventBus) {
+	e.events = events
+}
+
 // ExecuteTask executes a batch task on specified hosts
 func (e *BatchTaskExecutor) ExecuteTask(ctx context.Context, taskID uuid.UUID, hostIDs []uuid.UUID) error {
 	// Get batch task
@@ -45,17 +52,29 @@ func (e *BatchTaskExecutor) ExecuteTask(ctx context.Context, taskID uuid.UUID, h
 		return fmt.Errorf("failed to update task status: %w", err)
 	}
 
-	// Create task host records
-	taskHosts := make([]model.BatchTaskHost, len(hostIDs))
-	for i, hostID := range hostIDs {
-		taskHosts[i] = model.BatchTaskHost{
+	// Create task host records for hosts not registered when the task was created
+	var existingHostIDs []uuid.UUID
+	e.db.Model(&model.BatchTaskHost{}).Where("batch_task_id = ?", taskID).Pluck("host_id", &existingHostIDs)
+	existing := make(map[uuid.UUID]bool, len(existingHostIDs))
+	for _, hostID := range existingHostIDs {
+		existing[hostID] = true
+	}
+
+	var taskHosts []model.BatchTaskHost
+	for _, hostID := range hostIDs {
+		if existing[hostID] {
+			continue
+		}
+		taskHosts = append(taskHosts, model.BatchTaskHost{
 			BatchTaskID: taskID,
 			HostID:      hostID,
 			Status:      model.BatchTaskStatusPending,
-		}
+		})
 	}
-	if err := e.db.Create(&taskHosts).Error; err != nil {
-		return fmt.Errorf("failed to create task hosts: %w", err)
+	if len(taskHosts) > 0 {
+		if err := e.db.Create(&taskHosts).Error; err != nil {
+			return fmt.Errorf("failed to create task hosts: %w", err)
+		}
 	}
 
 	// Execute based on strategy
@@ -76,10 +95,20 @@ func (e *BatchTaskExecutor) executeParallel(ctx context.Context, task *model.Bat
 	var wg sync.WaitGroup
 	errChan := make(chan error, len(hostIDs))
 
+	// Parallelism caps concurrent hosts; 0 means all at once
+	var sem chan struct{}
+	if task.Parallelism > 0 {
+		sem = make(chan struct{}, task.Parallelism)
+	}
+
 	for _, hostID := range hostIDs {
 		wg.Add(1)
 		go func(hid uuid.UUID) {
 			defer wg.Done()
+			if sem != nil {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+			}
 			if err := e.executeOnHost(ctx, task, hid); err != nil {
 				e.logger.Error("task execution failed on host",
 					zap.String("taskId", task.ID.String()),
@@ -99,7 +128,7 @@ func (e *BatchTaskExecutor) executeParallel(ctx context.Context, task *model.Bat
 		hasErrors = true
 	}
 
-	return e.finalizeTask(task, hasErrors)
+	return e.finalizeTask(ctx, task, hasErrors)
 }
 
 // executeSerial executes the task on hosts one at a time
@@ -107,10 +136,8 @@ func (e *BatchTaskExecutor) executeSerial(ctx context.Context, task *model.Batch
 	hasErrors := false
 
 	for _, hostID := range hostIDs {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+		if ctx.Err() != nil {
+			break
 		}
 
 		if err := e.executeOnHost(ctx, task, hostID); err != nil {
@@ -122,7 +149,7 @@ func (e *BatchTaskExecutor) executeSerial(ctx context.Context, task *model.Batch
 		}
 	}
 
-	return e.finalizeTask(task, hasErrors)
+	return e.finalizeTask(ctx, task, hasErrors)
 }
 
 // executeRolling executes the task with a percentage of hosts at a time
@@ -166,11 +193,16 @@ func (e *BatchTaskExecutor) executeRolling(ctx context.Context, task *model.Batc
 		wg.Wait()
 	}
 
-	return e.finalizeTask(task, hasErrors)
+	return e.finalizeTask(ctx, task, hasErrors)
 }
 
 // executeOnHost executes the task on a single host
 func (e *BatchTaskExecutor) executeOnHost(ctx context.Context, task *model.BatchTask, hostID uuid.UUID) error {
+	// Hosts not started when the task is cancelled are cancelled with it
+	if ctx.Err() != nil {
+		return nil
+	}
+
 	// Get host
 	var host model.Host
 	if err := e.db.Where("id = ?", hostID).First(&host).Error; err != nil {
@@ -191,6 +223,13 @@ func (e *BatchTaskExecutor) executeOnHost(ctx context.Context, task *model.Batch
 		return fmt.Errorf("failed to update task host status: %w", err)
 	}
 
+	// File distributions push the staged file instead of running a command
+	if task.Type == model.BatchTaskTypeFileDistribution {
+		err := e.distributeToHost(&host, &taskHost)
+		e.updateProgress(ctx, task)
+		return err
+	}
+
 	// Create SSH config
 	config := &ssh.SSHConfig{
 		HostID:     host.ID.String(),
@@ -235,7 +274,7 @@ func (e *BatchTaskExecutor) executeOnHost(ctx context.Context, task *model.Batch
 	}
 
 	// Update task progress
-	e.updateProgress(task)
+	e.updateProgress(ctx, task)
 
 	return nil
 }
@@ -260,8 +299,9 @@ func (e *BatchTaskExecutor) markHostFailed(taskHost *model.BatchTaskHost, errMsg
 	return nil
 }
 
-// updateProgress updates the progress of a batch task
-func (e *BatchTaskExecutor) updateProgress(task *model.BatchTask) {
+// updateProgress updates the progress of a batch task, and of the operation
+// running it if there is one
+func (e *BatchTaskExecutor) updateProgress(ctx context.Context, task *model.BatchTask) {
 	var completedCount int64
 	e.db.Model(&model.BatchTaskHost{}).
 		Where("batch_task_id = ? AND status IN (?)", task.ID,
@@ -270,20 +310,46 @@ func (e *BatchTaskExecutor) updateProgress(task *model.BatchTask) {
 
 	task.CompletedHosts = int32(completedCount)
 	e.db.Save(task)
+	e.publish(task, model.EventBatchTaskProgress)
+	if task.TotalHosts > 0 {
+		ReportProgress(ctx, int(task.CompletedHosts*100/task.TotalHosts),
+			fmt.Sprintf("%d of %d hosts done", task.CompletedHosts, task.TotalHosts))
+	}
 }
 
-// finalizeTask finalizes a batch task after all hosts are processed
-func (e *BatchTaskExecutor) finalizeTask(task *model.BatchTask, hasErrors bool) error {
+// finalizeTask finalizes a batch task after all hosts are processed, or once the
+// hosts running when ctx was cancelled or timed out are
+func (e *BatchTaskExecutor) finalizeTask(ctx context.Context, task *model.BatchTask, hasErrors bool) error {
 	now := time.Now()
 	task.CompletedAt = &now
 
-	if hasErrors {
+	// Hosts left when the task timed out fail it, like hosts that failed
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		task.Status = model.BatchTaskStatusCancelled
+	case hasErrors || ctx.Err() != nil:
 		task.Status = model.BatchTaskStatusFailed
-	} else {
+	default:
 		task.Status = model.BatchTaskStatusCompleted
 	}
 
-	return e.db.Save(task).Error
+	if err := e.db.Save(task).Error; err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		e.cancelHosts(task.ID, now)
+	}
+	e.publish(task, model.EventBatchTaskFinished)
+	return nil
+}
+
+// publish publishes a batch task event with the task as its data
+func (e *BatchTaskExecutor) publish(task *model.BatchTask, eventType model.EventType) {
+	e.events.Publish(task.UserID, eventType, map[string]string{
+		"taskId": task.ID.String(),
+		"status": string(task.Status),
+		"type":   string(task.Type),
+	}, task)
 }
 
 // CancelTask cancels a running batch task
@@ -304,8 +370,13 @@ func (e *BatchTaskExecutor) CancelTask(ctx context.Context, taskID uuid.UUID) er
 	if err := e.db.Save(&task).Error; err != nil {
 		return fmt.Errorf("failed to cancel task: %w", err)
 	}
+	e.publish(&task, model.EventBatchTaskFinished)
+	e.cancelHosts(taskID, now)
+	return nil
+}
 
-	// Cancel pending/running task hosts
+// cancelHosts cancels the pending and running hosts of a task
+func (e *BatchTaskExecutor) cancelHosts(taskID uuid.UUID, now time.Time) {
 	e.db.Model(&model.BatchTaskHost{}).
 		Where("batch_task_id = ? AND status IN (?)", taskID,
 			[]string{string(model.BatchTaskStatusPending), string(model.BatchTaskStatusRunning)}).
@@ -313,8 +384,6 @@ func (e *BatchTaskExecutor) CancelTask(ctx context.Context, taskID uuid.UUID) er
 			"status":       model.BatchTaskStatusCancelled,
 			"completed_at": now,
 		})
-
-	return nil
 }
 
 // GetTaskProgress returns the progress of a batch task
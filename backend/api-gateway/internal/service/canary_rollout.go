@@ -0,0 +1,1032 @@
+// Package service provides canary and blue/green rollouts: a copy of a
+// deployment running a new image takes a growing share of its traffic while
+// Prometheus metrics, SLOs and alerts are watched, and is promoted to the
+// deployment or rolled back on regression
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// canaryTickInterval is how often active rollouts are advanced
+	canaryTickInterval = 10 * time.Second
+	// canaryActionTimeout bounds the cluster calls of advancing a rollout once
+	canaryActionTimeout = 30 * time.Second
+	// canaryDefaultInterval is the seconds between analyses by default
+	canaryDefaultInterval = 60
+	// canaryMinInterval and canaryMaxInterval bound the analysis interval
+	canaryMinInterval = 10
+	canaryMaxInterval = 3600
+	// canaryDefaultTimeout is the seconds the canary has to become ready at each step by default
+	canaryDefaultTimeout = 600
+	// canaryMinTimeout and canaryMaxTimeout bound the progress timeout
+	canaryMinTimeout = 60
+	canaryMaxTimeout = 3600
+	// canaryMaxStepDuration bounds how long a step is held
+	canaryMaxStepDuration = 24 * 3600
+	// canaryMaxSteps, canaryMaxMetrics and canaryMaxSLOs bound a rollout's definition
+	canaryMaxSteps   = 20
+	canaryMaxMetrics = 10
+	canaryMaxSLOs    = 10
+	// canaryMaxFailureLimit bounds the failed analyses in a row a rollout tolerates
+	canaryMaxFailureLimit = 10
+	// canaryMaxAnalyses is how many analyses a rollout keeps
+	canaryMaxAnalyses = 100
+	// canarySuffix names the deployment, Service and ingress a rollout creates
+	canarySuffix = "-canary"
+)
+
+// Actions waiting to be applied to a rollout
+const (
+	canaryActionPromote     = "promote"
+	canaryActionPromoteFull = "promote_full"
+	canaryActionAbort       = "abort"
+)
+
+// defaultCanarySteps are the steps of canary rollouts that name none
+var defaultCanarySteps = []model.CanaryStep{
+	{Weight: 10, Duration: 300},
+	{Weight: 25, Duration: 300},
+	{Weight: 50, Duration: 300},
+	{Weight: 100, Duration: 300},
+}
+
+var (
+	// ErrCanaryRolloutNotFound is returned when the rollout does not exist or the user may not view it
+	ErrCanaryRolloutNotFound = errors.New("canary rollout not found")
+	// ErrInvalidCanaryRollout is returned for rollouts whose definition is malformed
+	ErrInvalidCanaryRollout = errors.New("invalid canary rollout")
+	// ErrCanaryRolloutForbidden is returned when the user may view the rollout but not act on it
+	ErrCanaryRolloutForbidden = errors.New("not allowed on this canary rollout")
+	// ErrCanaryRolloutInProgress is returned when the deployment already has an active rollout
+	ErrCanaryRolloutInProgress = errors.New("a rollout of this deployment is already in progress")
+	// ErrCanaryRolloutFinished is returned for actions on rollouts that can no longer take them
+	ErrCanaryRolloutFinished = errors.New("canary rollout is not in progress")
+)
+
+// CanaryRolloutService runs canary and blue/green rollouts. Each rollout is a
+// state machine stored in the database that Run advances a little on every
+// tick, so rollouts carry on after a gateway restart. Rollouts belong to the
+// user who started them; the owner of the cluster and users allowed to
+// update workloads in the namespace may promote and abort them.
+type CanaryRolloutService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	slos   *SLOService
+	events *EventBus
+}
+
+// NewCanaryRolloutService creates a new canary rollout service. SLO checks
+// measure the SLOs through slos.
+func NewCanaryRolloutService(db *gorm.DB, logger *zap.Logger, slos *SLOService) *CanaryRolloutService {
+	return &CanaryRolloutService{db: db, logger: logger, slos: slos}
+}
+
+// SetEventBus sets the bus finished rollouts are published on
+func (s *CanaryRolloutService) SetEventBus(events *EventBus) {
+	s.events = events
+}
+
+// ============== Rollouts ==============
+
+// Rollouts lists the rollouts the user may view, newest first, optionally
+// those of one cluster and only the active ones
+func (s *CanaryRolloutService) Rollouts(userID uuid.UUID, clusterID *uuid.UUID, active bool) ([]model.CanaryRollout, error) {
+	query := s.db.Order("started_at DESC")
+	if clusterID != nil {
+		query = query.Where("cluster_id = ?", *clusterID)
+	}
+	if active {
+		query = query.Where("status IN ?", model.CanaryActiveStatuses)
+	}
+	var all []model.CanaryRollout
+	if err := query.Find(&all).Error; err != nil {
+		return nil, err
+	}
+	rollouts := []model.CanaryRollout{}
+	for i := range all {
+		if s.allowed(userID, &all[i], "list") {
+			rollouts = append(rollouts, all[i])
+		}
+	}
+	return rollouts, nil
+}
+
+// Rollout gets a rollout the user may view
+func (s *CanaryRolloutService) Rollout(userID, id uuid.UUID) (*model.CanaryRollout, error) {
+	return s.find(userID, id, "list")
+}
+
+// Create starts a rollout of an image to a deployment. The deployment must be
+// fully rolled out, and its Service, and ingress for nginx traffic, must route
+// to it. The canary is created at once; Run shifts traffic to it.
+func (s *CanaryRolloutService) Create(ctx context.Context, userID uuid.UUID, createdBy string, req *model.CreateCanaryRolloutRequest) (*model.CanaryRollout, error) {
+	rollout := &model.CanaryRollout{
+		ID:               uuid.New(),
+		UserID:           userID,
+		ClusterID:        req.ClusterID,
+		Namespace:        strings.TrimSpace(req.Namespace),
+		Deployment:       strings.TrimSpace(req.Deployment),
+		Container:        strings.TrimSpace(req.Container),
+		Image:            strings.TrimSpace(req.Image),
+		Strategy:         req.Strategy,
+		Traffic:          req.Traffic,
+		Service:          strings.TrimSpace(req.Service),
+		Ingress:          strings.TrimSpace(req.Ingress),
+		Steps:            req.Steps,
+		Metrics:          req.Metrics,
+		SLOIDs:           req.SLOIDs,
+		AlertSeverity:    req.AlertSeverity,
+		AnalysisInterval: req.AnalysisInterval,
+		FailureLimit:     req.FailureLimit,
+		ProgressTimeout:  req.ProgressTimeout,
+		Status:           model.CanaryProgressing,
+		Analyses:         []model.CanaryAnalysis{},
+		CreatedBy:        createdBy,
+		StartedAt:        time.Now(),
+	}
+	if err := s.validate(userID, rollout); err != nil {
+		return nil, err
+	}
+
+	client, err := s.clusterClient(rollout.ClusterID)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(ctx, canaryActionTimeout)
+	defer cancel()
+
+	if err := s.inspect(ctx, client, rollout); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var active int64
+		if err := tx.Model(&model.CanaryRollout{}).
+			Where("cluster_id = ? AND namespace = ? AND deployment = ? AND status IN ?",
+				rollout.ClusterID, rollout.Namespace, rollout.Deployment, model.CanaryActiveStatuses).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrCanaryRolloutInProgress
+		}
+		return tx.Create(rollout).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.setUp(ctx, client, rollout); err != nil {
+		s.rollBack(ctx, client, rollout, "failed to start: "+err.Error())
+		return nil, fmt.Errorf("failed to start canary rollout: %w", err)
+	}
+	if rollout.Steps[0].Manual {
+		rollout.Status = model.CanaryPaused
+	}
+	now := time.Now()
+	rollout.StepStartedAt = &now
+	if err := s.save(rollout); err != nil {
+		return nil, err
+	}
+	s.logger.Info("canary rollout started", zap.String("rolloutId", rollout.ID.String()),
+		zap.String("deployment", rollout.Namespace+"/"+rollout.Deployment), zap.String("image", rollout.Image))
+	return rollout, nil
+}
+
+// Promote moves a paused rollout on to its next step, or skips the rest of
+// the current step; with full it promotes the new image at once
+func (s *CanaryRolloutService) Promote(userID uuid.UUID, actionBy string, id uuid.UUID, full bool) (*model.CanaryRollout, error) {
+	action := canaryActionPromote
+	if full {
+		action = canaryActionPromoteFull
+	}
+	return s.act(userID, actionBy, id, action)
+}
+
+// Abort rolls a rollout back
+func (s *CanaryRolloutService) Abort(userID uuid.UUID, actionBy string, id uuid.UUID) (*model.CanaryRollout, error) {
+	return s.act(userID, actionBy, id, canaryActionAbort)
+}
+
+// act records an action for Run to apply on its next tick
+func (s *CanaryRolloutService) act(userID uuid.UUID, actionBy string, id uuid.UUID, action string) (*model.CanaryRollout, error) {
+	rollout, err := s.find(userID, id, "update")
+	if err != nil {
+		return nil, err
+	}
+	statuses := model.CanaryActiveStatuses
+	if action != canaryActionAbort {
+		statuses = []model.CanaryRolloutStatus{model.CanaryProgressing, model.CanaryPaused}
+	}
+	result := s.db.Model(&model.CanaryRollout{}).
+		Where("id = ? AND status IN ?", rollout.ID, statuses).
+		Updates(map[string]interface{}{"action": action, "action_by": actionBy})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrCanaryRolloutFinished
+	}
+	return s.find(userID, id, "list")
+}
+
+// Delete removes a finished rollout from the history
+func (s *CanaryRolloutService) Delete(userID, id uuid.UUID) error {
+	rollout, err := s.find(userID, id, "update")
+	if err != nil {
+		return err
+	}
+	result := s.db.Where("id = ? AND status NOT IN ?", rollout.ID, model.CanaryActiveStatuses).Delete(&model.CanaryRollout{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: abort the rollout before deleting it", ErrCanaryRolloutInProgress)
+	}
+	return nil
+}
+
+// validate checks a rollout's definition and fills in its defaults. The user
+// must own the cluster or be allowed to update workloads in the namespace.
+func (s *CanaryRolloutService) validate(userID uuid.UUID, rollout *model.CanaryRollout) error {
+	if !kubernetesName.MatchString(rollout.Namespace) {
+		return fmt.Errorf("%w: namespace must be a valid Kubernetes name", ErrInvalidCanaryRollout)
+	}
+	if !deploymentName.MatchString(rollout.Deployment) || len(rollout.Deployment)+len(canarySuffix) > 253 {
+		return fmt.Errorf("%w: deployment must be a valid Kubernetes name of at most %d characters", ErrInvalidCanaryRollout, 253-len(canarySuffix))
+	}
+	if rollout.Container != "" && !kubernetesName.MatchString(rollout.Container) {
+		return fmt.Errorf("%w: container must be a valid Kubernetes name", ErrInvalidCanaryRollout)
+	}
+	if rollout.Image == "" || len(rollout.Image) > 500 || strings.ContainsAny(rollout.Image, " \t\n") {
+		return fmt.Errorf("%w: image is required and must be at most 500 characters", ErrInvalidCanaryRollout)
+	}
+	if !kubernetesName.MatchString(rollout.Service) {
+		return fmt.Errorf("%w: service must be a valid Kubernetes name", ErrInvalidCanaryRollout)
+	}
+
+	switch rollout.Traffic {
+	case model.CanaryTrafficService:
+		rollout.Ingress = ""
+	case model.CanaryTrafficNginx:
+		if !deploymentName.MatchString(rollout.Ingress) || len(rollout.Ingress)+len(canarySuffix) > 253 {
+			return fmt.Errorf("%w: ingress must be a valid Kubernetes name for nginx traffic", ErrInvalidCanaryRollout)
+		}
+		if len(rollout.Service)+len(canarySuffix) > 63 {
+			return fmt.Errorf("%w: service must be at most %d characters for nginx traffic", ErrInvalidCanaryRollout, 63-len(canarySuffix))
+		}
+	default:
+		return fmt.Errorf("%w: traffic must be service or nginx", ErrInvalidCanaryRollout)
+	}
+
+	switch rollout.Strategy {
+	case model.CanaryStrategyCanary:
+		if len(rollout.Steps) == 0 {
+			rollout.Steps = defaultCanarySteps
+		}
+	case model.CanaryStrategyBlueGreen:
+		if rollout.Traffic != model.CanaryTrafficService {
+			return fmt.Errorf("%w: blue/green rollouts switch the service; traffic must be service", ErrInvalidCanaryRollout)
+		}
+		if len(rollout.Steps) == 0 {
+			rollout.Steps = []model.CanaryStep{{Weight: 100, Duration: 300}}
+		}
+		if len(rollout.Steps) != 1 || rollout.Steps[0].Weight != 100 {
+			return fmt.Errorf("%w: blue/green rollouts take one step of weight 100", ErrInvalidCanaryRollout)
+		}
+	default:
+		return fmt.Errorf("%w: strategy must be canary or blue_green", ErrInvalidCanaryRollout)
+	}
+	if len(rollout.Steps) > canaryMaxSteps {
+		return fmt.Errorf("%w: at most %d steps", ErrInvalidCanaryRollout, canaryMaxSteps)
+	}
+	last := 0
+	for i, step := range rollout.Steps {
+		if step.Weight <= last || step.Weight > 100 {
+			return fmt.Errorf("%w: step %d: weights must increase and be at most 100", ErrInvalidCanaryRollout, i+1)
+		}
+		if step.Duration < 0 || step.Duration > canaryMaxStepDuration {
+			return fmt.Errorf("%w: step %d: duration must be between 0 and %d seconds", ErrInvalidCanaryRollout, i+1, canaryMaxStepDuration)
+		}
+		last = step.Weight
+	}
+
+	if len(rollout.Metrics) > canaryMaxMetrics {
+		return fmt.Errorf("%w: at most %d metrics", ErrInvalidCanaryRollout, canaryMaxMetrics)
+	}
+	for i := range rollout.Metrics {
+		metric := &rollout.Metrics[i]
+		metric.Name = strings.TrimSpace(metric.Name)
+		metric.Query = strings.TrimSpace(metric.Query)
+		if metric.Name == "" || len(metric.Name) > 100 || metric.Query == "" {
+			return fmt.Errorf("%w: metric %d: name and query are required", ErrInvalidCanaryRollout, i+1)
+		}
+		if metric.Max == nil && metric.Min == nil {
+			return fmt.Errorf("%w: metric %s: max or min is required", ErrInvalidCanaryRollout, metric.Name)
+		}
+		var count int64
+		if err := s.db.Model(&model.PrometheusDataSource{}).Where("id = ? AND user_id = ?", metric.DataSourceID, userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: metric %s: data source not found", ErrInvalidCanaryRollout, metric.Name)
+		}
+	}
+	if len(rollout.SLOIDs) > canaryMaxSLOs {
+		return fmt.Errorf("%w: at most %d SLOs", ErrInvalidCanaryRollout, canaryMaxSLOs)
+	}
+	for _, id := range rollout.SLOIDs {
+		if _, err := s.slos.find(userID, id); err != nil {
+			if errors.Is(err, ErrSLONotFound) {
+				return fmt.Errorf("%w: SLO %s not found", ErrInvalidCanaryRollout, id)
+			}
+			return err
+		}
+	}
+	switch rollout.AlertSeverity {
+	case "", model.AlertSeverityInfo, model.AlertSeverityWarning, model.AlertSeverityCritical:
+	default:
+		return fmt.Errorf("%w: alertSeverity must be info, warning or critical", ErrInvalidCanaryRollout)
+	}
+
+	if rollout.AnalysisInterval == 0 {
+		rollout.AnalysisInterval = canaryDefaultInterval
+	}
+	if rollout.AnalysisInterval < canaryMinInterval || rollout.AnalysisInterval > canaryMaxInterval {
+		return fmt.Errorf("%w: analysisInterval must be between %d and %d seconds", ErrInvalidCanaryRollout, canaryMinInterval, canaryMaxInterval)
+	}
+	if rollout.FailureLimit < 0 || rollout.FailureLimit > canaryMaxFailureLimit {
+		return fmt.Errorf("%w: failureLimit must be between 0 and %d", ErrInvalidCanaryRollout, canaryMaxFailureLimit)
+	}
+	if rollout.ProgressTimeout == 0 {
+		rollout.ProgressTimeout = canaryDefaultTimeout
+	}
+	if rollout.ProgressTimeout < canaryMinTimeout || rollout.ProgressTimeout > canaryMaxTimeout {
+		return fmt.Errorf("%w: progressTimeout must be between %d and %d seconds", ErrInvalidCanaryRollout, canaryMinTimeout, canaryMaxTimeout)
+	}
+
+	var cluster model.K8sCluster
+	if err := s.db.Where("id = ?", rollout.ClusterID).First(&cluster).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrClusterNotFound
+		}
+		return err
+	}
+	if cluster.UserID != userID && !model.UserHasNamespacePermission(s.db, userID, "workloads", "update", cluster.ID, rollout.Namespace).Allowed {
+		return fmt.Errorf("%w: permission workloads.update required in namespace %s", ErrCanaryRolloutForbidden, rollout.Namespace)
+	}
+	return nil
+}
+
+// inspect records the stable deployment's container, image and replicas, and
+// checks that its Service and ingress route to it
+func (s *CanaryRolloutService) inspect(ctx context.Context, client *k8s.ClusterClient, rollout *model.CanaryRollout) error {
+	container, image, err := client.DeploymentImage(ctx, rollout.Namespace, rollout.Deployment, rollout.Container)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCanaryRollout, err)
+	}
+	if image == rollout.Image {
+		return fmt.Errorf("%w: deployment %s already runs %s", ErrInvalidCanaryRollout, rollout.Deployment, image)
+	}
+	rollout.Container = container
+	rollout.Previous = image
+
+	status, err := client.DeploymentRolloutStatus(ctx, rollout.Namespace, rollout.Deployment)
+	if err != nil {
+		return err
+	}
+	if !status.Done {
+		return fmt.Errorf("%w: deployment %s is rolling out: %s", ErrInvalidCanaryRollout, rollout.Deployment, status.Message)
+	}
+	if status.Replicas < 1 {
+		return fmt.Errorf("%w: deployment %s is scaled to zero", ErrInvalidCanaryRollout, rollout.Deployment)
+	}
+	rollout.StableReplicas = status.Replicas
+
+	if err := client.CheckServiceSelects(ctx, rollout.Namespace, rollout.Service, rollout.Deployment); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCanaryRollout, err)
+	}
+	if rollout.Traffic == model.CanaryTrafficNginx {
+		if err := client.CheckIngressRoutes(ctx, rollout.Namespace, rollout.Ingress, rollout.Service); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCanaryRollout, err)
+		}
+	}
+	return nil
+}
+
+// setUp creates the canary. Rollouts other than replica-weighted canaries pin
+// the Service to the stable pods first, as the canary's pods share its labels.
+func (s *CanaryRolloutService) setUp(ctx context.Context, client *k8s.ClusterClient, rollout *model.CanaryRollout) error {
+	hash, err := client.DeploymentPodTemplateHash(ctx, rollout.Namespace, rollout.Deployment)
+	if err != nil {
+		return err
+	}
+	rollout.StableHash = hash
+	if canaryPinned(rollout) {
+		if err := client.PinServiceSelector(ctx, rollout.Namespace, rollout.Service, hash); err != nil {
+			return err
+		}
+	}
+	if rollout.Traffic == model.CanaryTrafficNginx {
+		if err := client.ApplyCanaryService(ctx, rollout.Namespace, rollout.Service+canarySuffix, rollout.Service, rollout.ID.String()); err != nil {
+			return err
+		}
+	}
+
+	replicas := int32(0)
+	if rollout.Strategy == model.CanaryStrategyBlueGreen {
+		replicas = rollout.StableReplicas
+	}
+	return client.CreateCanaryDeployment(ctx, &k8s.CanaryDeploymentSpec{
+		Namespace: rollout.Namespace,
+		Stable:    rollout.Deployment,
+		Name:      rollout.Deployment + canarySuffix,
+		Container: rollout.Container,
+		Image:     rollout.Image,
+		Replicas:  replicas,
+		Rollout:   rollout.ID.String(),
+	})
+}
+
+// find loads a rollout the user may act on. Rollouts the user may not view are
+// not found.
+func (s *CanaryRolloutService) find(userID, id uuid.UUID, action string) (*model.CanaryRollout, error) {
+	var rollout model.CanaryRollout
+	if err := s.db.Where("id = ?", id).First(&rollout).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCanaryRolloutNotFound
+		}
+		return nil, err
+	}
+	if !s.allowed(userID, &rollout, action) {
+		if action != "list" && s.allowed(userID, &rollout, "list") {
+			return nil, fmt.Errorf("%w: permission workloads.%s required in namespace %s", ErrCanaryRolloutForbidden, action, rollout.Namespace)
+		}
+		return nil, ErrCanaryRolloutNotFound
+	}
+	return &rollout, nil
+}
+
+// allowed reports whether the user started the rollout, owns its cluster or
+// holds the workloads permission for action in its namespace
+func (s *CanaryRolloutService) allowed(userID uuid.UUID, rollout *model.CanaryRollout, action string) bool {
+	if rollout.UserID == userID {
+		return true
+	}
+	var cluster model.K8sCluster
+	if err := s.db.Select("id", "user_id").Where("id = ?", rollout.ClusterID).First(&cluster).Error; err == nil && cluster.UserID == userID {
+		return true
+	}
+	return model.UserHasNamespacePermission(s.db, userID, "workloads", action, rollout.ClusterID, rollout.Namespace).Allowed
+}
+
+// ============== Progression ==============
+
+// Run advances the active rollouts every ten seconds until ctx is cancelled
+func (s *CanaryRolloutService) Run(ctx context.Context) {
+	ticker := time.NewTicker(canaryTickInterval)
+	defer ticker.Stop()
+
+	for {
+		s.advanceActive(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// advanceActive advances every active rollout not advanced in the last tick.
+// A rollout is claimed by moving its update time, so each is advanced once
+// per tick even with several gateway replicas.
+func (s *CanaryRolloutService) advanceActive(ctx context.Context) {
+	now := time.Now()
+	cutoff := now.Add(-canaryTickInterval / 2)
+	var active []model.CanaryRollout
+	if err := s.db.Where("status IN ? AND updated_at < ?", model.CanaryActiveStatuses, cutoff).Find(&active).Error; err != nil {
+		s.logger.Error("failed to load canary rollouts", zap.Error(err))
+		return
+	}
+
+	for i := range active {
+		rollout := &active[i]
+		claim := s.db.Model(&model.CanaryRollout{}).
+			Where("id = ? AND updated_at < ?", rollout.ID, cutoff).
+			Update("updated_at", now)
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+		s.advance(ctx, rollout)
+	}
+}
+
+// advance takes the next action of a rollout: applies a promote or abort,
+// shifts traffic, analyzes, moves to the next step or finishes a promotion.
+// Errors of the cluster roll the rollout back.
+func (s *CanaryRolloutService) advance(ctx context.Context, rollout *model.CanaryRollout) {
+	client, err := s.clusterClient(rollout.ClusterID)
+	if err != nil {
+		s.logger.Warn("failed to connect to canary rollout cluster", zap.String("rolloutId", rollout.ID.String()), zap.Error(err))
+		return
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(ctx, canaryActionTimeout)
+	defer cancel()
+
+	if rollout.Action == canaryActionAbort {
+		s.rollBack(ctx, client, rollout, "aborted by "+rollout.ActionBy)
+		return
+	}
+	if rollout.Status == model.CanaryPromoting {
+		err = s.finishPromotion(ctx, client, rollout)
+	} else {
+		err = s.progress(ctx, client, rollout, time.Now())
+	}
+	if err != nil {
+		s.rollBack(ctx, client, rollout, err.Error())
+	}
+}
+
+// progress advances a progressing or paused rollout
+func (s *CanaryRolloutService) progress(ctx context.Context, client *k8s.ClusterClient, rollout *model.CanaryRollout, now time.Time) error {
+	switch {
+	case rollout.Action == canaryActionPromoteFull:
+		s.consumeAction(rollout)
+		return s.promote(ctx, client, rollout, now)
+	case rollout.Status == model.CanaryPaused && rollout.Action == canaryActionPromote:
+		s.consumeAction(rollout)
+		rollout.Status = model.CanaryProgressing
+		rollout.StepStartedAt = &now
+	case rollout.Status == model.CanaryPaused:
+		// The analysis goes on at the previous step's weight
+		if err := s.analyzeDue(ctx, rollout, now); err != nil {
+			return err
+		}
+		return s.save(rollout)
+	}
+
+	step := rollout.Steps[rollout.Step]
+	if rollout.ShiftedAt == nil {
+		shifted, err := s.shift(ctx, client, rollout, step)
+		if err != nil {
+			return err
+		}
+		if !shifted {
+			if rollout.StepStartedAt != nil && now.Sub(*rollout.StepStartedAt) > time.Duration(rollout.ProgressTimeout)*time.Second {
+				return fmt.Errorf("canary was not ready for %d%% of traffic within %d seconds", step.Weight, rollout.ProgressTimeout)
+			}
+			return s.save(rollout)
+		}
+		rollout.Weight = step.Weight
+		rollout.ShiftedAt = &now
+		return s.save(rollout)
+	}
+
+	if err := s.analyzeDue(ctx, rollout, now); err != nil {
+		return err
+	}
+
+	analyzed := !canaryAnalyzes(rollout) || (rollout.LastAnalysisAt != nil && !rollout.LastAnalysisAt.Before(*rollout.ShiftedAt))
+	held := now.Sub(*rollout.ShiftedAt) >= time.Duration(step.Duration)*time.Second
+	if rollout.Action == canaryActionPromote {
+		s.consumeAction(rollout)
+		held, analyzed = true, true
+	}
+	if !held || !analyzed {
+		return s.save(rollout)
+	}
+
+	if rollout.Step == len(rollout.Steps)-1 {
+		return s.promote(ctx, client, rollout, now)
+	}
+	rollout.Step++
+	rollout.StepStartedAt = &now
+	rollout.ShiftedAt = nil
+	if rollout.Steps[rollout.Step].Manual {
+		rollout.Status = model.CanaryPaused
+	}
+	return s.save(rollout)
+}
+
+// shift moves traffic to a step's weight and reports whether it got there.
+// The canary is scaled first and traffic only moves once it is ready.
+func (s *CanaryRolloutService) shift(ctx context.Context, client *k8s.ClusterClient, rollout *model.CanaryRollout, step model.CanaryStep) (bool, error) {
+	canary := rollout.Deployment + canarySuffix
+	replicas := canaryReplicas(rollout.StableReplicas, step.Weight)
+	if rollout.Strategy == model.CanaryStrategyBlueGreen {
+		replicas = rollout.StableReplicas
+	}
+	if err := client.SetDeploymentReplicas(ctx, rollout.Namespace, canary, replicas); err != nil {
+		return false, err
+	}
+	status, err := client.DeploymentRolloutStatus(ctx, rollout.Namespace, canary)
+	if err != nil {
+		return false, err
+	}
+	if status.Failed {
+		return false, fmt.Errorf("canary failed to roll out: %s", status.Message)
+	}
+	if !status.Done {
+		rollout.Message = "Waiting for the canary: " + status.Message
+		return false, nil
+	}
+
+	switch {
+	case rollout.Strategy == model.CanaryStrategyBlueGreen:
+		hash, err := client.DeploymentPodTemplateHash(ctx, rollout.Namespace, canary)
+		if err != nil {
+			return false, err
+		}
+		if err := client.PinServiceSelector(ctx, rollout.Namespace, rollout.Service, hash); err != nil {
+			return false, err
+		}
+	case rollout.Traffic == model.CanaryTrafficNginx:
+		if err := client.ApplyCanaryIngress(ctx, rollout.Namespace, rollout.Ingress+canarySuffix, rollout.Ingress,
+			rollout.Service, rollout.Service+canarySuffix, rollout.ID.String(), step.Weight); err != nil {
+			return false, err
+		}
+	default:
+		if err := client.SetDeploymentReplicas(ctx, rollout.Namespace, rollout.Deployment, rollout.StableReplicas-replicas); err != nil {
+			return false, err
+		}
+	}
+	rollout.Message = fmt.Sprintf("%d%% of traffic on %s", step.Weight, rollout.Image)
+	return true, nil
+}
+
+// promote sets the new image on the stable deployment. Blue/green rollouts
+// keep the Service on the new pods while the deployment rolls out; nginx
+// canaries release it to both deployments, whose pods all end up new.
+func (s *CanaryRolloutService) promote(ctx context.Context, client *k8s.ClusterClient, rollout *model.CanaryRollout, now time.Time) error {
+	switch {
+	case rollout.Strategy == model.CanaryStrategyBlueGreen:
+		hash, err := client.DeploymentPodTemplateHash(ctx, rollout.Namespace, rollout.Deployment+canarySuffix)
+		if err != nil {
+			return err
+		}
+		if err := client.PinServiceSelector(ctx, rollout.Namespace, rollout.Service, hash); err != nil {
+			return err
+		}
+	case rollout.Traffic == model.CanaryTrafficNginx:
+		if err := client.PinServiceSelector(ctx, rollout.Namespace, rollout.Service, ""); err != nil {
+			return err
+		}
+	}
+	if rollout.Traffic == model.CanaryTrafficService {
+		if err := client.SetDeploymentReplicas(ctx, rollout.Namespace, rollout.Deployment, rollout.StableReplicas); err != nil {
+			return err
+		}
+	}
+	if err := client.SetDeploymentImage(ctx, rollout.Namespace, rollout.Deployment, rollout.Container, rollout.Image); err != nil {
+		return err
+	}
+
+	rollout.Status = model.CanaryPromoting
+	rollout.StepStartedAt = &now
+	rollout.Message = "Rolling " + rollout.Image + " out to " + rollout.Deployment
+	return s.save(rollout)
+}
+
+// finishPromotion removes the canary once the stable deployment runs the new
+// image
+func (s *CanaryRolloutService) finishPromotion(ctx context.Context, client *k8s.ClusterClient, rollout *model.CanaryRollout) error {
+	status, err := client.DeploymentRolloutStatus(ctx, rollout.Namespace, rollout.Deployment)
+	if err != nil {
+		return err
+	}
+	if status.Failed {
+		return fmt.Errorf("promotion failed to roll out: %s", status.Message)
+	}
+	if !status.Done {
+		if rollout.StepStartedAt != nil && time.Since(*rollout.StepStartedAt) > time.Duration(rollout.ProgressTimeout)*time.Second {
+			return fmt.Errorf("promotion did not roll out within %d seconds: %s", rollout.ProgressTimeout, status.Message)
+		}
+		return s.save(rollout)
+	}
+
+	if canaryPinned(rollout) {
+		if err := client.PinServiceSelector(ctx, rollout.Namespace, rollout.Service, ""); err != nil {
+			return err
+		}
+	}
+	if err := s.removeCanary(ctx, client, rollout); err != nil {
+		return err
+	}
+	s.finish(rollout, model.CanaryPromoted, rollout.Image+" promoted to "+rollout.Deployment)
+	return nil
+}
+
+// rollBack restores the stable deployment and its traffic and removes the
+// canary. A rollout that cannot be rolled back fails.
+func (s *CanaryRolloutService) rollBack(ctx context.Context, client *k8s.ClusterClient, rollout *model.CanaryRollout, reason string) {
+	err := s.restore(ctx, client, rollout)
+	if err != nil {
+		s.finish(rollout, model.CanaryFailed, reason+"; rollback failed: "+err.Error())
+		return
+	}
+	s.finish(rollout, model.CanaryRolledBack, reason)
+}
+
+func (s *CanaryRolloutService) restore(ctx context.Context, client *k8s.ClusterClient, rollout *model.CanaryRollout) error {
+	if rollout.Status == model.CanaryPromoting {
+		if err := client.SetDeploymentImage(ctx, rollout.Namespace, rollout.Deployment, rollout.Container, rollout.Previous); err != nil {
+			return err
+		}
+	}
+	pinned := canaryPinned(rollout) && rollout.StableHash != ""
+	if pinned {
+		if err := client.PinServiceSelector(ctx, rollout.Namespace, rollout.Service, rollout.StableHash); err != nil {
+			return err
+		}
+	}
+	if rollout.Traffic == model.CanaryTrafficService && rollout.StableReplicas > 0 {
+		if err := client.SetDeploymentReplicas(ctx, rollout.Namespace, rollout.Deployment, rollout.StableReplicas); err != nil {
+			return err
+		}
+	}
+	if err := s.removeCanary(ctx, client, rollout); err != nil {
+		return err
+	}
+	if pinned {
+		return client.PinServiceSelector(ctx, rollout.Namespace, rollout.Service, "")
+	}
+	return nil
+}
+
+// removeCanary deletes the objects the rollout created
+func (s *CanaryRolloutService) removeCanary(ctx context.Context, client *k8s.ClusterClient, rollout *model.CanaryRollout) error {
+	var ingress, service string
+	if rollout.Traffic == model.CanaryTrafficNginx {
+		ingress = rollout.Ingress + canarySuffix
+		service = rollout.Service + canarySuffix
+	}
+	return client.DeleteCanaryResources(ctx, rollout.Namespace, rollout.ID.String(), ingress, rollout.Deployment+canarySuffix, service)
+}
+
+// finish records the outcome of a rollout and publishes it
+func (s *CanaryRolloutService) finish(rollout *model.CanaryRollout, status model.CanaryRolloutStatus, message string) {
+	now := time.Now()
+	rollout.Status = status
+	rollout.Message = message
+	rollout.FinishedAt = &now
+	if status != model.CanaryPromoted {
+		rollout.Weight = 0
+	}
+	if rollout.Action != "" {
+		s.consumeAction(rollout)
+	}
+	if err := s.save(rollout); err != nil {
+		s.logger.Error("failed to record canary rollout", zap.String("rolloutId", rollout.ID.String()), zap.Error(err))
+	}
+
+	if status == model.CanaryPromoted {
+		s.logger.Info("canary rollout promoted", zap.String("rolloutId", rollout.ID.String()), zap.String("image", rollout.Image))
+	} else {
+		s.logger.Warn("canary rollout rolled back", zap.String("rolloutId", rollout.ID.String()), zap.String("status", string(status)),
+			zap.String("message", message))
+	}
+	s.events.Publish(rollout.UserID, model.EventCanaryRolloutFinished, map[string]string{
+		"rolloutId": rollout.ID.String(),
+		"clusterId": rollout.ClusterID.String(),
+		"strategy":  string(rollout.Strategy),
+		"status":    string(status),
+	}, rollout)
+}
+
+// save stores a rollout's progress. Actions are written by the API while the
+// rollout advances, so they are left alone; consumeAction clears them.
+func (s *CanaryRolloutService) save(rollout *model.CanaryRollout) error {
+	return s.db.Omit("action", "action_by").Save(rollout).Error
+}
+
+// consumeAction clears the action being applied
+func (s *CanaryRolloutService) consumeAction(rollout *model.CanaryRollout) {
+	if err := s.db.Model(&model.CanaryRollout{}).
+		Where("id = ? AND action = ?", rollout.ID, rollout.Action).
+		Update("action", "").Error; err != nil {
+		s.logger.Error("failed to clear canary rollout action", zap.String("rolloutId", rollout.ID.String()), zap.Error(err))
+	}
+	rollout.Action = ""
+}
+
+// ============== Analysis ==============
+
+// analyzeDue analyzes the rollout when traffic has been on the canary for an
+// analysis interval since the last analysis. It returns an error once more
+// analyses failed in a row than the rollout tolerates.
+func (s *CanaryRolloutService) analyzeDue(ctx context.Context, rollout *model.CanaryRollout, now time.Time) error {
+	if !canaryAnalyzes(rollout) || (rollout.ShiftedAt == nil && rollout.LastAnalysisAt == nil) {
+		return nil
+	}
+	since := rollout.LastAnalysisAt
+	if since == nil || (rollout.ShiftedAt != nil && rollout.ShiftedAt.After(*since)) {
+		since = rollout.ShiftedAt
+	}
+	if now.Sub(*since) < time.Duration(rollout.AnalysisInterval)*time.Second {
+		return nil
+	}
+
+	analysis := s.analyze(ctx, rollout, now)
+	rollout.Analyses = append(rollout.Analyses, analysis)
+	if len(rollout.Analyses) > canaryMaxAnalyses {
+		rollout.Analyses = rollout.Analyses[len(rollout.Analyses)-canaryMaxAnalyses:]
+	}
+	rollout.LastAnalysisAt = &now
+	if analysis.Passed {
+		rollout.Failures = 0
+		return nil
+	}
+	rollout.Failures++
+	if rollout.Failures <= rollout.FailureLimit {
+		return nil
+	}
+
+	var failed []string
+	for _, check := range analysis.Checks {
+		if !check.Passed {
+			failed = append(failed, check.Name+": "+check.Message)
+		}
+	}
+	return fmt.Errorf("analysis failed at %d%% of traffic: %s", rollout.Weight, strings.Join(failed, "; "))
+}
+
+// analyze evaluates the rollout's metrics, SLOs and alerts. A check that
+// cannot be evaluated fails.
+func (s *CanaryRolloutService) analyze(ctx context.Context, rollout *model.CanaryRollout, now time.Time) model.CanaryAnalysis {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	analysis := model.CanaryAnalysis{At: now, Step: rollout.Step, Weight: rollout.Weight, Passed: true, Checks: []model.CanaryCheck{}}
+	add := func(check model.CanaryCheck) {
+		analysis.Checks = append(analysis.Checks, check)
+		analysis.Passed = analysis.Passed && check.Passed
+	}
+
+	for _, metric := range rollout.Metrics {
+		add(s.checkMetric(ctx, rollout, metric, now))
+	}
+	for _, id := range rollout.SLOIDs {
+		add(s.checkSLO(ctx, rollout, id, now))
+	}
+	if rollout.AlertSeverity != "" {
+		add(s.checkAlerts(rollout))
+	}
+	return analysis
+}
+
+func (s *CanaryRolloutService) checkMetric(ctx context.Context, rollout *model.CanaryRollout, metric model.CanaryMetric, now time.Time) model.CanaryCheck {
+	check := model.CanaryCheck{Kind: "metric", Name: metric.Name}
+	var ds model.PrometheusDataSource
+	if err := s.db.Where("id = ? AND user_id = ?", metric.DataSourceID, rollout.UserID).First(&ds).Error; err != nil {
+		check.Message = "data source not found"
+		return check
+	}
+	client, err := NewDataSourceQuerier(s.db, &ds)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	value, err := s.slos.instant(ctx, client, metric.Query, now)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+
+	check.Value = &value
+	switch {
+	case metric.Max != nil && value > *metric.Max:
+		check.Message = fmt.Sprintf("%g is above %g", value, *metric.Max)
+	case metric.Min != nil && value < *metric.Min:
+		check.Message = fmt.Sprintf("%g is below %g", value, *metric.Min)
+	default:
+		check.Passed = true
+	}
+	return check
+}
+
+// checkSLO measures an SLO's SLI over the last analysis interval, which must
+// meet its objective. An interval without events passes.
+func (s *CanaryRolloutService) checkSLO(ctx context.Context, rollout *model.CanaryRollout, id uuid.UUID, now time.Time) model.CanaryCheck {
+	check := model.CanaryCheck{Kind: "slo", Name: id.String()}
+	slo, err := s.slos.find(rollout.UserID, id)
+	if err != nil {
+		check.Message = "SLO not found"
+		return check
+	}
+	check.Name = slo.Name
+	client, err := s.slos.client(slo)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	sli, err := s.slos.ratio(ctx, client, slo, rollout.AnalysisInterval, now)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	if sli == nil {
+		check.Passed = true
+		check.Message = "no events"
+		return check
+	}
+
+	check.Value = sli
+	if *sli < slo.Objective {
+		check.Message = fmt.Sprintf("SLI %.3f%% is below the objective of %g%%", *sli, slo.Objective)
+	} else {
+		check.Passed = true
+	}
+	return check
+}
+
+// checkAlerts fails while alerts of the cluster at least as severe as the
+// rollout's alert severity, fired since the rollout started, are firing
+func (s *CanaryRolloutService) checkAlerts(rollout *model.CanaryRollout) model.CanaryCheck {
+	check := model.CanaryCheck{Kind: "alerts", Name: "alerts"}
+	var severities []model.AlertSeverity
+	for _, severity := range []model.AlertSeverity{model.AlertSeverityCritical, model.AlertSeverityWarning, model.AlertSeverityInfo} {
+		if severityRank(string(severity)) <= severityRank(string(rollout.AlertSeverity)) {
+			severities = append(severities, severity)
+		}
+	}
+
+	var alerts []model.Alert
+	if err := s.db.Where("cluster_id = ? AND status = ? AND severity IN ? AND started_at >= ?",
+		rollout.ClusterID, model.AlertStatusFiring, severities, rollout.StartedAt).
+		Order("started_at").Limit(5).Find(&alerts).Error; err != nil {
+		check.Message = err.Error()
+		return check
+	}
+
+	count := float64(len(alerts))
+	check.Value = &count
+	if len(alerts) == 0 {
+		check.Passed = true
+		return check
+	}
+	titles := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		titles = append(titles, alert.Title)
+	}
+	check.Message = "firing: " + strings.Join(titles, ", ")
+	return check
+}
+
+func (s *CanaryRolloutService) clusterClient(clusterID uuid.UUID) (*k8s.ClusterClient, error) {
+	var cluster model.K8sCluster
+	if err := s.db.Where("id = ?", clusterID).First(&cluster).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrClusterNotFound
+		}
+		return nil, err
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+	return client, nil
+}
+
+// canaryPinned reports whether a rollout pins the Service to one set of pods:
+// blue/green rollouts switch it between them, and nginx canaries keep the
+// canary's pods out of it
+func canaryPinned(rollout *model.CanaryRollout) bool {
+	return rollout.Strategy == model.CanaryStrategyBlueGreen || rollout.Traffic == model.CanaryTrafficNginx
+}
+
+// canaryAnalyzes reports whether a rollout has checks to analyze
+func canaryAnalyzes(rollout *model.CanaryRollout) bool {
+	return len(rollout.Metrics) > 0 || len(rollout.SLOIDs) > 0 || rollout.AlertSeverity != ""
+}
+
+// canaryReplicas is the canary's share of the stable replicas for a weight,
+// at least one and at most all of them. Replica-weighted traffic is split in
+// proportion, so its weights are approximate.
+func canaryReplicas(stable int32, weight int) int32 {
+	replicas := int32(math.Ceil(float64(stable) * float64(weight) / 100))
+	if replicas < 1 {
+		replicas = 1
+	}
+	if replicas > stable {
+		replicas = stable
+	}
+	return replicas
+}
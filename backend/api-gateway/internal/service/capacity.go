@@ -0,0 +1,465 @@
+// Package service provides business logic for cluster capacity analysis
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// Capacity analysis tuning
+const (
+	// CapacityThresholdPercent is the node usage considered exhausted
+	CapacityThresholdPercent = 85.0
+	// rightsizingHeadroom is applied to peak usage when recommending requests
+	rightsizingHeadroom = 1.2
+	// overProvisionedRatio flags workloads whose peak stays below this share of requests
+	overProvisionedRatio = 0.5
+	// runwayWarningDays flags nodes projected to run out within this many days
+	runwayWarningDays = 14.0
+	// lowEfficiencyPercent flags namespaces using less than this share of their requests
+	lowEfficiencyPercent = 30.0
+	// maxRecommendations caps the workloads listed per recommendation kind
+	maxRecommendations = 5
+
+	minCPURequestCores    = 0.01
+	minMemoryRequestBytes = 16 * 1024 * 1024
+)
+
+// CapacityService analyzes collected metrics against resource requests
+type CapacityService struct {
+	db *gorm.DB
+}
+
+// NewCapacityService creates a new capacity service
+func NewCapacityService(db *gorm.DB) *CapacityService {
+	return &CapacityService{db: db}
+}
+
+// Analyze builds a capacity report for a cluster from the metrics collected within window
+func (s *CapacityService) Analyze(ctx context.Context, cluster *model.K8sCluster, window time.Duration) (*model.CapacityReport, error) {
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cluster client: %w", err)
+	}
+	defer client.Close()
+
+	pods, err := client.GetPodResources(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	since := now.Add(-window).Unix()
+
+	var podMetrics []model.PodMetric
+	if err := s.db.Where("cluster_id = ? AND timestamp >= ?", cluster.ID, since).
+		Find(&podMetrics).Error; err != nil {
+		return nil, fmt.Errorf("failed to load pod metrics: %w", err)
+	}
+
+	var nodeMetrics []model.NodeMetric
+	if err := s.db.Where("cluster_id = ? AND timestamp >= ?", cluster.ID, since).
+		Order("timestamp ASC").
+		Find(&nodeMetrics).Error; err != nil {
+		return nil, fmt.Errorf("failed to load node metrics: %w", err)
+	}
+
+	return BuildCapacityReport(cluster.ID, pods, podMetrics, nodeMetrics, window, now), nil
+}
+
+// podUsage aggregates the usage samples of one pod
+type podUsage struct {
+	samples    int
+	cpuSum     float64
+	cpuPeak    float64
+	memorySum  int64
+	memoryPeak int64
+}
+
+func (u *podUsage) cpuAvg() float64 {
+	return u.cpuSum / float64(u.samples)
+}
+
+func (u *podUsage) memoryAvg() int64 {
+	return u.memorySum / int64(u.samples)
+}
+
+// BuildCapacityReport compares pod requests with usage samples and projects node runway
+func BuildCapacityReport(clusterID uuid.UUID, pods []k8s.PodResources, podMetrics []model.PodMetric, nodeMetrics []model.NodeMetric, window time.Duration, now time.Time) *model.CapacityReport {
+	usage := make(map[string]*podUsage)
+	for _, m := range podMetrics {
+		key := m.Namespace + "/" + m.PodName
+		u, ok := usage[key]
+		if !ok {
+			u = &podUsage{}
+			usage[key] = u
+		}
+		u.samples++
+		u.cpuSum += m.CPUUsageCores
+		u.memorySum += m.MemoryUsageBytes
+		u.cpuPeak = math.Max(u.cpuPeak, m.CPUUsageCores)
+		if m.MemoryUsageBytes > u.memoryPeak {
+			u.memoryPeak = m.MemoryUsageBytes
+		}
+	}
+
+	report := &model.CapacityReport{
+		ClusterID:    clusterID,
+		GeneratedAt:  now,
+		WindowHours:  int(window.Hours()),
+		ThresholdPct: CapacityThresholdPercent,
+		Namespaces:   analyzeNamespaces(pods, usage),
+		Workloads:    analyzeWorkloads(pods, usage),
+		Nodes:        projectNodeRunway(nodeMetrics, now),
+	}
+	report.Recommendations = capacityRecommendations(report)
+	return report
+}
+
+// analyzeNamespaces sums requests and average usage per namespace
+func analyzeNamespaces(pods []k8s.PodResources, usage map[string]*podUsage) []model.NamespaceCapacity {
+	byNamespace := make(map[string]*model.NamespaceCapacity)
+	for _, pod := range pods {
+		ns, ok := byNamespace[pod.Namespace]
+		if !ok {
+			ns = &model.NamespaceCapacity{Namespace: pod.Namespace}
+			byNamespace[pod.Namespace] = ns
+		}
+		ns.PodCount++
+		ns.CPURequestCores += pod.CPURequestCores
+		ns.MemoryRequestBytes += pod.MemoryRequestBytes
+		if u, ok := usage[pod.Namespace+"/"+pod.PodName]; ok {
+			ns.CPUUsageCores += u.cpuAvg()
+			ns.MemoryUsageBytes += u.memoryAvg()
+		}
+	}
+
+	result := make([]model.NamespaceCapacity, 0, len(byNamespace))
+	for _, ns := range byNamespace {
+		if ns.CPURequestCores > 0 {
+			ns.CPUEfficiency = roundTo(ns.CPUUsageCores/ns.CPURequestCores*100, 2)
+		}
+		if ns.MemoryRequestBytes > 0 {
+			ns.MemoryEfficiency = roundTo(float64(ns.MemoryUsageBytes)/float64(ns.MemoryRequestBytes)*100, 2)
+		}
+		ns.CPURequestCores = roundTo(ns.CPURequestCores, 3)
+		ns.CPUUsageCores = roundTo(ns.CPUUsageCores, 3)
+		result = append(result, *ns)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Namespace < result[j].Namespace
+	})
+	return result
+}
+
+// analyzeWorkloads derives per-pod request recommendations for each workload with usage samples
+func analyzeWorkloads(pods []k8s.PodResources, usage map[string]*podUsage) []model.WorkloadRecommendation {
+	type workload struct {
+		rec       model.WorkloadRecommendation
+		sampled   int
+		cpuAvgSum float64
+		memAvgSum int64
+	}
+
+	byWorkload := make(map[string]*workload)
+	var order []string
+	for _, pod := range pods {
+		if pod.WorkloadName == "" {
+			continue
+		}
+		key := pod.Namespace + "/" + pod.WorkloadKind + "/" + pod.WorkloadName
+		w, ok := byWorkload[key]
+		if !ok {
+			w = &workload{rec: model.WorkloadRecommendation{
+				Namespace: pod.Namespace,
+				Kind:      pod.WorkloadKind,
+				Name:      pod.WorkloadName,
+			}}
+			byWorkload[key] = w
+			order = append(order, key)
+		}
+		w.rec.Replicas++
+		// Pods of a workload share a template, so the largest request is the current one
+		w.rec.CPURequestCores = math.Max(w.rec.CPURequestCores, pod.CPURequestCores)
+		if pod.MemoryRequestBytes > w.rec.MemoryRequestBytes {
+			w.rec.MemoryRequestBytes = pod.MemoryRequestBytes
+		}
+
+		u, ok := usage[pod.Namespace+"/"+pod.PodName]
+		if !ok {
+			continue
+		}
+		w.sampled++
+		w.cpuAvgSum += u.cpuAvg()
+		w.memAvgSum += u.memoryAvg()
+		w.rec.CPUPeakUsageCores = math.Max(w.rec.CPUPeakUsageCores, u.cpuPeak)
+		if u.memoryPeak > w.rec.MemoryPeakUsageBytes {
+			w.rec.MemoryPeakUsageBytes = u.memoryPeak
+		}
+	}
+
+	result := []model.WorkloadRecommendation{}
+	for _, key := range order {
+		w := byWorkload[key]
+		if w.sampled == 0 {
+			continue
+		}
+		rec := w.rec
+		rec.CPUAvgUsageCores = roundTo(w.cpuAvgSum/float64(w.sampled), 4)
+		rec.MemoryAvgUsageBytes = w.memAvgSum / int64(w.sampled)
+
+		rec.CPUVerdict = rightsizingVerdict(rec.CPURequestCores, rec.CPUPeakUsageCores)
+		rec.MemoryVerdict = rightsizingVerdict(float64(rec.MemoryRequestBytes), float64(rec.MemoryPeakUsageBytes))
+
+		rec.RecommendedCPURequestCores = rec.CPURequestCores
+		if rec.CPUVerdict != model.RightsizingBalanced {
+			rec.RecommendedCPURequestCores = roundTo(math.Max(rec.CPUPeakUsageCores*rightsizingHeadroom, minCPURequestCores), 3)
+		}
+		rec.RecommendedMemoryRequestBytes = rec.MemoryRequestBytes
+		if rec.MemoryVerdict != model.RightsizingBalanced {
+			recommended := int64(float64(rec.MemoryPeakUsageBytes) * rightsizingHeadroom)
+			if recommended < minMemoryRequestBytes {
+				recommended = minMemoryRequestBytes
+			}
+			rec.RecommendedMemoryRequestBytes = recommended
+		}
+
+		result = append(result, rec)
+	}
+	return result
+}
+
+// rightsizingVerdict classifies a request against peak usage
+func rightsizingVerdict(request, peak float64) model.RightsizingVerdict {
+	switch {
+	case request <= 0:
+		return model.RightsizingNoRequests
+	case peak > request:
+		return model.RightsizingUnderProvisioned
+	case peak < request*overProvisionedRatio:
+		return model.RightsizingOverProvisioned
+	default:
+		return model.RightsizingBalanced
+	}
+}
+
+// projectNodeRunway fits a linear trend to each node's usage and projects when it
+// crosses CapacityThresholdPercent. Samples must be ordered by timestamp.
+func projectNodeRunway(nodeMetrics []model.NodeMetric, now time.Time) []model.NodeRunway {
+	byNode := make(map[string][]model.NodeMetric)
+	var order []string
+	for _, m := range nodeMetrics {
+		if _, ok := byNode[m.NodeName]; !ok {
+			order = append(order, m.NodeName)
+		}
+		byNode[m.NodeName] = append(byNode[m.NodeName], m)
+	}
+	sort.Strings(order)
+
+	result := make([]model.NodeRunway, 0, len(order))
+	for _, name := range order {
+		samples := byNode[name]
+		latest := samples[len(samples)-1]
+
+		runway := model.NodeRunway{
+			NodeName:        name,
+			CPUUsagePercent: roundTo(latest.CPUUsagePercent, 2),
+			Samples:         len(samples),
+		}
+		if latest.MemoryTotalBytes > 0 {
+			runway.MemoryUsagePercent = roundTo(float64(latest.MemoryUsageBytes)/float64(latest.MemoryTotalBytes)*100, 2)
+		}
+
+		cpuSlope, cpuOK := usageSlopePerDay(samples, func(m model.NodeMetric) float64 {
+			return m.CPUUsagePercent
+		})
+		memSlope, memOK := usageSlopePerDay(samples, func(m model.NodeMetric) float64 {
+			if m.MemoryTotalBytes == 0 {
+				return 0
+			}
+			return float64(m.MemoryUsageBytes) / float64(m.MemoryTotalBytes) * 100
+		})
+		if cpuOK {
+			runway.CPUGrowthPerDay = roundTo(cpuSlope, 3)
+			runway.CPURunwayDays = runwayDays(runway.CPUUsagePercent, cpuSlope)
+		}
+		if memOK {
+			runway.MemoryGrowthPerDay = roundTo(memSlope, 3)
+			runway.MemoryRunwayDays = runwayDays(runway.MemoryUsagePercent, memSlope)
+		}
+
+		var days *float64
+		for _, d := range []*float64{runway.CPURunwayDays, runway.MemoryRunwayDays} {
+			if d != nil && (days == nil || *d < *days) {
+				days = d
+			}
+		}
+		if days != nil {
+			exhaustedAt := now.Add(time.Duration(*days * float64(24*time.Hour)))
+			runway.ExhaustedAt = &exhaustedAt
+		}
+
+		result = append(result, runway)
+	}
+	return result
+}
+
+// usageSlopePerDay returns the least squares slope of value over time, in units per day
+func usageSlopePerDay(samples []model.NodeMetric, value func(model.NodeMetric) float64) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+
+	origin := samples[0].Timestamp
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := float64(s.Timestamp-origin) / 86400
+		y := value(s)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
+
+// runwayDays returns the days until current reaches the threshold at the given growth,
+// or nil when usage is not growing
+func runwayDays(current, slopePerDay float64) *float64 {
+	var days float64
+	switch {
+	case current >= CapacityThresholdPercent:
+		days = 0
+	case slopePerDay <= 0:
+		return nil
+	default:
+		days = roundTo((CapacityThresholdPercent-current)/slopePerDay, 1)
+	}
+	return &days
+}
+
+// capacityRecommendations summarizes the report as human readable recommendations
+func capacityRecommendations(report *model.CapacityReport) []string {
+	recommendations := []string{}
+
+	for _, node := range report.Nodes {
+		if node.ExhaustedAt == nil {
+			continue
+		}
+		days := node.ExhaustedAt.Sub(report.GeneratedAt).Hours() / 24
+		if days > runwayWarningDays {
+			continue
+		}
+		if days <= 0 {
+			recommendations = append(recommendations, fmt.Sprintf(
+				"Node %s is above %.0f%% usage (CPU %.1f%%, memory %.1f%%); add capacity or rebalance workloads",
+				node.NodeName, report.ThresholdPct, node.CPUUsagePercent, node.MemoryUsagePercent))
+		} else {
+			recommendations = append(recommendations, fmt.Sprintf(
+				"Node %s is projected to reach %.0f%% usage in %.1f days at the current growth rate",
+				node.NodeName, report.ThresholdPct, days))
+		}
+	}
+
+	var over, under []model.WorkloadRecommendation
+	for _, w := range report.Workloads {
+		if w.CPUVerdict == model.RightsizingUnderProvisioned || w.MemoryVerdict == model.RightsizingUnderProvisioned {
+			under = append(under, w)
+		} else if w.CPUVerdict == model.RightsizingOverProvisioned || w.MemoryVerdict == model.RightsizingOverProvisioned {
+			over = append(over, w)
+		}
+	}
+
+	// Largest reclaimable CPU first
+	sort.Slice(over, func(i, j int) bool {
+		return reclaimableCPU(over[i]) > reclaimableCPU(over[j])
+	})
+	for i, w := range over {
+		if i == maxRecommendations {
+			break
+		}
+		recommendations = append(recommendations, fmt.Sprintf(
+			"%s %s/%s is over-provisioned: lower requests to %s CPU / %s memory per pod (currently %s / %s)",
+			w.Kind, w.Namespace, w.Name,
+			formatCores(w.RecommendedCPURequestCores), formatBytes(w.RecommendedMemoryRequestBytes),
+			formatCores(w.CPURequestCores), formatBytes(w.MemoryRequestBytes)))
+	}
+
+	for i, w := range under {
+		if i == maxRecommendations {
+			break
+		}
+		recommendations = append(recommendations, fmt.Sprintf(
+			"%s %s/%s peaks above its requests: raise requests to %s CPU / %s memory per pod (currently %s / %s)",
+			w.Kind, w.Namespace, w.Name,
+			formatCores(w.RecommendedCPURequestCores), formatBytes(w.RecommendedMemoryRequestBytes),
+			formatCores(w.CPURequestCores), formatBytes(w.MemoryRequestBytes)))
+	}
+
+	for _, ns := range report.Namespaces {
+		if ns.CPURequestCores > 0 && ns.CPUUsageCores > 0 && ns.CPUEfficiency < lowEfficiencyPercent {
+			recommendations = append(recommendations, fmt.Sprintf(
+				"Namespace %s uses %.1f%% of its %.2f requested CPU cores",
+				ns.Namespace, ns.CPUEfficiency, ns.CPURequestCores))
+		}
+	}
+
+	return recommendations
+}
+
+// CapacityContext renders a capacity report as plain text for the AI assistant
+func CapacityContext(report *model.CapacityReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Capacity analysis of cluster %s over the last %d hours (generated %s):\n",
+		report.ClusterID, report.WindowHours, report.GeneratedAt.UTC().Format(time.RFC3339))
+	if len(report.Recommendations) == 0 {
+		b.WriteString("- No capacity issues found.\n")
+	}
+	for _, rec := range report.Recommendations {
+		b.WriteString("- " + rec + "\n")
+	}
+	return b.String()
+}
+
+func reclaimableCPU(w model.WorkloadRecommendation) float64 {
+	return (w.CPURequestCores - w.RecommendedCPURequestCores) * float64(w.Replicas)
+}
+
+func formatCores(cores float64) string {
+	if cores < 1 {
+		return fmt.Sprintf("%dm", int64(math.Round(cores*1000)))
+	}
+	return fmt.Sprintf("%.2f", cores)
+}
+
+func formatBytes(bytes int64) string {
+	const mi = 1024 * 1024
+	if bytes >= 1024*mi {
+		return fmt.Sprintf("%.1fGi", float64(bytes)/(1024*mi))
+	}
+	return fmt.Sprintf("%dMi", bytes/mi)
+}
+
+func roundTo(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
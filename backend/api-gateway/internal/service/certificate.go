@@ -0,0 +1,732 @@
+// Package service provides expiry monitoring of TLS certificates served by
+// endpoints, ingresses and embedded in kubeconfigs
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// certificateCheckInterval is how often all certificates are checked
+	certificateCheckInterval = time.Hour
+	// certificateProbeTimeout bounds the TLS handshake with an endpoint
+	certificateProbeTimeout = 10 * time.Second
+	// certificateClusterTimeout bounds the discovery in one cluster
+	certificateClusterTimeout = time.Minute
+	// certificateConcurrency is how many endpoints and clusters are checked at once
+	certificateConcurrency = 8
+	defaultCertificatePort = 443
+)
+
+var (
+	// ErrCertificateNotFound is returned when the user has no such certificate
+	ErrCertificateNotFound = errors.New("certificate not found")
+	// ErrInvalidCertificate is returned for invalid certificate requests
+	ErrInvalidCertificate = errors.New("invalid certificate")
+)
+
+// certificateLevels orders the expiry statuses by urgency; statuses without a
+// level are never notified
+var certificateLevels = map[model.CertificateStatus]int{
+	model.CertificateStatusValid:    0,
+	model.CertificateStatusWarning:  1,
+	model.CertificateStatusCritical: 2,
+	model.CertificateStatusExpired:  3,
+}
+
+// CertificateService keeps an inventory of TLS certificates and when they
+// expire: endpoints users monitor, the TLS entries of cluster ingresses and the
+// certificates in cluster kubeconfigs. Owners are notified each time a
+// certificate reaches a more urgent status, except kubeconfig certificates,
+// whose owners ClusterCredentialService already warns.
+type CertificateService struct {
+	db            *gorm.DB
+	logger        *zap.Logger
+	settings      *SettingsService
+	events        *EventBus
+	notifications *NotificationService
+}
+
+// NewCertificateService creates a new certificate service
+func NewCertificateService(db *gorm.DB, logger *zap.Logger, settings *SettingsService) *CertificateService {
+	return &CertificateService{
+		db:            db,
+		logger:        logger,
+		settings:      settings,
+		notifications: NewNotificationService(db, logger),
+	}
+}
+
+// SetEventBus sets the bus certificate expiry events are published on
+func (s *CertificateService) SetEventBus(events *EventBus) {
+	s.events = events
+	s.notifications.SetEventBus(events)
+}
+
+// ============== Inventory ==============
+
+// List returns a page of the user's certificates, those expiring first first,
+// with the counts of all the user's certificates by status
+func (s *CertificateService) List(filter *model.CertificateFilter) ([]model.CertificateResponse, int64, model.CertificateSummary, error) {
+	query := s.db.Model(&model.Certificate{}).Where("user_id = ?", filter.UserID)
+	if filter.Source != "" {
+		query = query.Where("source = ?", filter.Source)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.ClusterID != nil {
+		query = query.Where("cluster_id = ?", *filter.ClusterID)
+	}
+	if filter.Search != "" {
+		pattern := sanitize.Contains(filter.Search)
+		query = query.Where("name ILIKE ? OR host ILIKE ? OR subject ILIKE ? OR dns_names ILIKE ?", pattern, pattern, pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, nil, err
+	}
+	var certs []model.Certificate
+	err := query.Order("not_after IS NULL, not_after").Order("name").
+		Limit(filter.PageSize).Offset((filter.Page - 1) * filter.PageSize).
+		Find(&certs).Error
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	var counts []struct {
+		Status model.CertificateStatus
+		Count  int64
+	}
+	err = s.db.Model(&model.Certificate{}).Select("status, COUNT(*) AS count").
+		Where("user_id = ?", filter.UserID).Group("status").Scan(&counts).Error
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	summary := model.CertificateSummary{}
+	for _, c := range counts {
+		summary[c.Status] = c.Count
+	}
+
+	now := time.Now()
+	resp := make([]model.CertificateResponse, 0, len(certs))
+	for i := range certs {
+		resp = append(resp, certs[i].Response(now))
+	}
+	return resp, total, summary, nil
+}
+
+// Get gets one of the user's certificates
+func (s *CertificateService) Get(userID, id uuid.UUID) (*model.CertificateResponse, error) {
+	cert, err := s.find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	resp := cert.Response(time.Now())
+	return &resp, nil
+}
+
+func (s *CertificateService) find(userID, id uuid.UUID) (*model.Certificate, error) {
+	var cert model.Certificate
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&cert).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCertificateNotFound
+		}
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// Create starts monitoring the certificate of a TLS endpoint and checks it at once
+func (s *CertificateService) Create(ctx context.Context, userID uuid.UUID, req *model.CreateCertificateRequest) (*model.CertificateResponse, error) {
+	cert := &model.Certificate{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Source:       model.CertificateSourceEndpoint,
+		Name:         strings.TrimSpace(req.Name),
+		Host:         strings.TrimSpace(req.Host),
+		Port:         req.Port,
+		ServerName:   strings.TrimSpace(req.ServerName),
+		WarningDays:  req.WarningDays,
+		CriticalDays: req.CriticalDays,
+		Enabled:      true,
+		Status:       model.CertificateStatusUnknown,
+	}
+	if cert.Port == 0 {
+		cert.Port = defaultCertificatePort
+	}
+	if err := validateCertificate(cert); err != nil {
+		return nil, err
+	}
+	if cert.Name == "" {
+		cert.Name = net.JoinHostPort(cert.Host, strconv.Itoa(cert.Port))
+	}
+	cert.Key = endpointCertificateKey(cert)
+
+	var existing int64
+	if err := s.db.Model(&model.Certificate{}).Where("user_id = ? AND key = ?", userID, cert.Key).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("%w: the endpoint is already monitored", ErrInvalidCertificate)
+	}
+	if err := s.db.Create(cert).Error; err != nil {
+		return nil, err
+	}
+
+	s.checkEndpoint(ctx, cert, time.Now())
+	return s.Get(userID, cert.ID)
+}
+
+// Update changes the given fields of one of the user's certificates and checks
+// it again when its endpoint changed
+func (s *CertificateService) Update(ctx context.Context, userID, id uuid.UUID, req *model.UpdateCertificateRequest) (*model.CertificateResponse, error) {
+	cert, err := s.find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Source != model.CertificateSourceEndpoint && (req.Host != nil || req.Port != nil || req.ServerName != nil) {
+		return nil, fmt.Errorf("%w: host, port and serverName only apply to endpoint certificates", ErrInvalidCertificate)
+	}
+
+	moved := false
+	if req.Name != nil {
+		cert.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Host != nil {
+		cert.Host, moved = strings.TrimSpace(*req.Host), true
+	}
+	if req.Port != nil {
+		cert.Port, moved = *req.Port, true
+	}
+	if req.ServerName != nil {
+		cert.ServerName, moved = strings.TrimSpace(*req.ServerName), true
+	}
+	if req.WarningDays != nil {
+		cert.WarningDays = *req.WarningDays
+	}
+	if req.CriticalDays != nil {
+		cert.CriticalDays = *req.CriticalDays
+	}
+	if req.Enabled != nil {
+		cert.Enabled = *req.Enabled
+	}
+	if cert.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidCertificate)
+	}
+	if err := validateCertificate(cert); err != nil {
+		return nil, err
+	}
+	if moved {
+		cert.Key = endpointCertificateKey(cert)
+		var existing int64
+		if err := s.db.Model(&model.Certificate{}).Where("user_id = ? AND key = ? AND id <> ?", userID, cert.Key, cert.ID).Count(&existing).Error; err != nil {
+			return nil, err
+		}
+		if existing > 0 {
+			return nil, fmt.Errorf("%w: the endpoint is already monitored", ErrInvalidCertificate)
+		}
+	}
+
+	// New thresholds may change the status without a new check
+	if cert.NotAfter != nil {
+		cert.Status = s.status(cert, time.Now())
+	}
+	err = s.db.Model(cert).Select("name", "host", "port", "server_name", "key", "warning_days", "critical_days", "enabled", "status").
+		Updates(cert).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if moved && cert.Enabled {
+		s.checkEndpoint(ctx, cert, time.Now())
+	}
+	return s.Get(userID, cert.ID)
+}
+
+// Delete stops monitoring an endpoint certificate. Discovered certificates go
+// when their ingress or kubeconfig does; they can only be disabled.
+func (s *CertificateService) Delete(userID, id uuid.UUID) error {
+	cert, err := s.find(userID, id)
+	if err != nil {
+		return err
+	}
+	if cert.Source != model.CertificateSourceEndpoint {
+		return fmt.Errorf("%w: discovered certificates cannot be deleted; disable them instead", ErrInvalidCertificate)
+	}
+	return s.db.Delete(cert).Error
+}
+
+// validateCertificate checks the endpoint and thresholds of a certificate
+func validateCertificate(cert *model.Certificate) error {
+	if cert.Source == model.CertificateSourceEndpoint {
+		if cert.Host == "" || strings.ContainsAny(cert.Host, "/ ") || strings.Contains(cert.Host, ":") && net.ParseIP(cert.Host) == nil {
+			return fmt.Errorf("%w: host must be a host name or address without a scheme or port", ErrInvalidCertificate)
+		}
+		if cert.Port < 1 || cert.Port > 65535 {
+			return fmt.Errorf("%w: port must be between 1 and 65535", ErrInvalidCertificate)
+		}
+	}
+	if cert.WarningDays < 0 || cert.CriticalDays < 0 {
+		return fmt.Errorf("%w: thresholds must not be negative", ErrInvalidCertificate)
+	}
+	if cert.WarningDays > 0 && cert.CriticalDays > cert.WarningDays {
+		return fmt.Errorf("%w: criticalDays must not exceed warningDays", ErrInvalidCertificate)
+	}
+	return nil
+}
+
+// endpointCertificateKey identifies a monitored endpoint among the user's certificates
+func endpointCertificateKey(cert *model.Certificate) string {
+	return fmt.Sprintf("endpoint/%s/%s", net.JoinHostPort(strings.ToLower(cert.Host), strconv.Itoa(cert.Port)), strings.ToLower(cert.ServerName))
+}
+
+// ============== Checks ==============
+
+// Run checks all certificates now and then hourly until ctx is cancelled
+func (s *CertificateService) Run(ctx context.Context) {
+	ticker := time.NewTicker(certificateCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.CheckAll(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll checks every enabled endpoint certificate and discovers the
+// certificates of every cluster reached with a kubeconfig
+func (s *CertificateService) CheckAll(ctx context.Context, now time.Time) {
+	var endpoints []model.Certificate
+	if err := s.db.Where("source = ? AND enabled = ?", model.CertificateSourceEndpoint, true).Find(&endpoints).Error; err != nil {
+		s.logger.Error("failed to load endpoint certificates", zap.Error(err))
+	}
+	var clusters []model.K8sCluster
+	if err := s.db.Where("kubeconfig <> ''").Find(&clusters).Error; err != nil {
+		s.logger.Error("failed to load clusters for certificate discovery", zap.Error(err))
+	}
+	s.check(ctx, endpoints, clusters, now)
+}
+
+// Scan checks the user's endpoint certificates and discovers the certificates
+// of the user's clusters now
+func (s *CertificateService) Scan(ctx context.Context, userID uuid.UUID) error {
+	var endpoints []model.Certificate
+	err := s.db.Where("user_id = ? AND source = ? AND enabled = ?", userID, model.CertificateSourceEndpoint, true).Find(&endpoints).Error
+	if err != nil {
+		return err
+	}
+	var clusters []model.K8sCluster
+	if err := s.db.Where("user_id = ? AND kubeconfig <> ''", userID).Find(&clusters).Error; err != nil {
+		return err
+	}
+	s.check(ctx, endpoints, clusters, time.Now())
+	return nil
+}
+
+// Check checks one of the user's certificates now. Discovered certificates are
+// checked by discovering the certificates of their cluster again.
+func (s *CertificateService) Check(ctx context.Context, userID, id uuid.UUID) (*model.CertificateResponse, error) {
+	cert, err := s.find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if cert.Source == model.CertificateSourceEndpoint {
+		s.checkEndpoint(ctx, cert, now)
+	} else if cert.ClusterID != nil {
+		var cluster model.K8sCluster
+		if err := s.db.Where("id = ? AND user_id = ?", *cert.ClusterID, userID).First(&cluster).Error; err != nil {
+			return nil, err
+		}
+		s.discover(ctx, &cluster, now)
+	}
+	return s.Get(userID, id)
+}
+
+// check runs the endpoint checks and cluster discoveries a few at a time
+func (s *CertificateService) check(ctx context.Context, endpoints []model.Certificate, clusters []model.K8sCluster, now time.Time) {
+	slots := make(chan struct{}, certificateConcurrency)
+	var wg sync.WaitGroup
+	run := func(f func()) {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			f()
+		}()
+	}
+	for i := range endpoints {
+		cert := &endpoints[i]
+		run(func() { s.checkEndpoint(ctx, cert, now) })
+	}
+	for i := range clusters {
+		cluster := &clusters[i]
+		run(func() { s.discover(ctx, cluster, now) })
+	}
+	wg.Wait()
+}
+
+// checkEndpoint fetches the certificate an endpoint serves and records it
+func (s *CertificateService) checkEndpoint(ctx context.Context, cert *model.Certificate, now time.Time) {
+	leaf, verifyErr, err := fetchCertificate(ctx, cert.Host, cert.Port, cert.ServerName)
+	found := *cert
+	found.LastError, found.VerifyError = "", verifyErr
+	if err != nil {
+		found.LastError = err.Error()
+	} else {
+		applyCertificate(&found, leaf)
+	}
+	s.record(cert, &found, now)
+}
+
+// discover records the certificates of a cluster's ingresses and kubeconfig and
+// removes those of the cluster that are gone. Certificates of a kind that
+// could not be listed are kept as they were.
+func (s *CertificateService) discover(ctx context.Context, cluster *model.K8sCluster, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, certificateClusterTimeout)
+	defer cancel()
+
+	seen := map[model.CertificateSource][]string{}
+	found := map[model.CertificateSource]bool{}
+
+	certs, err := k8s.KubeconfigCertificates([]byte(cluster.Kubeconfig))
+	if err != nil {
+		s.logger.Warn("failed to read kubeconfig certificates", zap.String("clusterId", cluster.ID.String()), zap.Error(err))
+	} else {
+		found[model.CertificateSourceKubeconfig] = true
+		for _, kc := range certs {
+			fingerprint := certificateFingerprint(kc.Certificate)
+			cert := model.Certificate{
+				UserID:    cluster.UserID,
+				Source:    model.CertificateSourceKubeconfig,
+				Key:       fmt.Sprintf("kubeconfig/%s/%s/%s", cluster.ID, kc.Role, fingerprint),
+				Name:      fmt.Sprintf("%s %s", cluster.Name, kc.Role),
+				Host:      serverHost(kc.Server),
+				ClusterID: &cluster.ID,
+				Resource:  fmt.Sprintf("%s/%s", kc.Context, kc.Role),
+			}
+			applyCertificate(&cert, kc.Certificate)
+			s.upsert(&cert, now)
+			seen[cert.Source] = append(seen[cert.Source], cert.Key)
+		}
+	}
+
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		s.logger.Warn("failed to connect to cluster for certificate discovery", zap.String("clusterId", cluster.ID.String()), zap.Error(err))
+	} else {
+		defer client.Close()
+		entries, err := client.ListIngressTLS(ctx)
+		if err != nil {
+			s.logger.Warn("failed to list ingress certificates", zap.String("clusterId", cluster.ID.String()), zap.Error(err))
+		} else {
+			found[model.CertificateSourceIngress] = true
+			for _, entry := range entries {
+				cert := s.ingressCertificate(ctx, cluster, &entry)
+				s.upsert(cert, now)
+				seen[cert.Source] = append(seen[cert.Source], cert.Key)
+			}
+		}
+	}
+
+	for source := range found {
+		query := s.db.Where("cluster_id = ? AND source = ?", cluster.ID, source)
+		if keys := seen[source]; len(keys) > 0 {
+			query = query.Where("key NOT IN ?", keys)
+		}
+		if err := query.Delete(&model.Certificate{}).Error; err != nil {
+			s.logger.Error("failed to remove stale certificates", zap.String("clusterId", cluster.ID.String()), zap.Error(err))
+		}
+	}
+}
+
+// ingressCertificate describes the certificate of an ingress TLS entry. When
+// its secret cannot be read, the certificate its first host serves is used.
+func (s *CertificateService) ingressCertificate(ctx context.Context, cluster *model.K8sCluster, entry *k8s.IngressTLS) *model.Certificate {
+	host := ""
+	if len(entry.Hosts) > 0 {
+		host = entry.Hosts[0]
+	}
+	secret := entry.SecretName
+	if secret == "" {
+		secret = "-"
+	}
+	cert := &model.Certificate{
+		UserID:    cluster.UserID,
+		Source:    model.CertificateSourceIngress,
+		Key:       fmt.Sprintf("ingress/%s/%s/%s/%s", cluster.ID, entry.Namespace, entry.Ingress, secret),
+		Name:      fmt.Sprintf("%s/%s", entry.Namespace, entry.Ingress),
+		Host:      host,
+		ClusterID: &cluster.ID,
+		Namespace: entry.Namespace,
+		Resource:  fmt.Sprintf("%s/%s", entry.Ingress, entry.SecretName),
+	}
+	if host != "" {
+		cert.Port = defaultCertificatePort
+	}
+
+	switch {
+	case entry.Certificate != nil:
+		applyCertificate(cert, entry.Certificate)
+	case host != "" && !strings.HasPrefix(host, "*."):
+		leaf, verifyErr, err := fetchCertificate(ctx, host, defaultCertificatePort, "")
+		if err != nil {
+			cert.LastError = fmt.Sprintf("%s; %v", entry.Error, err)
+		} else {
+			applyCertificate(cert, leaf)
+			cert.VerifyError = verifyErr
+		}
+	default:
+		cert.LastError = entry.Error
+	}
+	return cert
+}
+
+// upsert records a discovered certificate, keeping the name, thresholds and
+// enabled flag users set on certificates already in the inventory
+func (s *CertificateService) upsert(found *model.Certificate, now time.Time) {
+	var existing model.Certificate
+	err := s.db.Where("user_id = ? AND key = ?", found.UserID, found.Key).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		found.ID = uuid.New()
+		found.Enabled = true
+		found.Status = model.CertificateStatusUnknown
+		if err := s.db.Create(found).Error; err != nil {
+			s.logger.Error("failed to add discovered certificate", zap.String("key", found.Key), zap.Error(err))
+			return
+		}
+		existing = *found
+	} else if err != nil {
+		s.logger.Error("failed to load discovered certificate", zap.String("key", found.Key), zap.Error(err))
+		return
+	}
+	found.ID, found.Name = existing.ID, existing.Name
+	found.WarningDays, found.CriticalDays, found.Enabled = existing.WarningDays, existing.CriticalDays, existing.Enabled
+	s.record(&existing, found, now)
+}
+
+// record stores what a check found for a certificate and notifies the owner
+// when it reached a more urgent status
+func (s *CertificateService) record(cert, found *model.Certificate, now time.Time) {
+	status := s.status(found, now)
+	updates := map[string]interface{}{
+		"host":            found.Host,
+		"port":            found.Port,
+		"namespace":       found.Namespace,
+		"resource":        found.Resource,
+		"subject":         found.Subject,
+		"issuer":          found.Issuer,
+		"dns_names":       found.DNSNames,
+		"serial":          found.Serial,
+		"fingerprint":     found.Fingerprint,
+		"not_before":      found.NotBefore,
+		"not_after":       found.NotAfter,
+		"verify_error":    found.VerifyError,
+		"status":          status,
+		"last_error":      found.LastError,
+		"last_checked_at": now,
+	}
+	if err := s.db.Model(&model.Certificate{}).Where("id = ?", cert.ID).Updates(updates).Error; err != nil {
+		s.logger.Error("failed to record certificate check", zap.String("certificateId", cert.ID.String()), zap.Error(err))
+		return
+	}
+
+	level, ok := certificateLevels[status]
+	if !ok || !found.Enabled {
+		return
+	}
+	from := cert.NotifiedLevel
+	// Only the checker that moves the level notifies, and renewals are silent
+	result := s.db.Model(&model.Certificate{}).
+		Where("id = ? AND COALESCE(notified_level, '') = ?", cert.ID, from).
+		Update("notified_level", status)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	if fromLevel, ok := certificateLevels[from]; (ok && level <= fromLevel) || (!ok && status == model.CertificateStatusValid) {
+		return
+	}
+	if found.Source == model.CertificateSourceKubeconfig {
+		return
+	}
+
+	found.ID, found.Status, found.NotifiedLevel, found.LastCheckedAt = cert.ID, status, status, &now
+	s.announce(found, now)
+}
+
+// status returns how close a certificate is to expiring at now
+func (s *CertificateService) status(cert *model.Certificate, now time.Time) model.CertificateStatus {
+	if cert.NotAfter == nil {
+		if cert.LastError != "" {
+			return model.CertificateStatusError
+		}
+		return model.CertificateStatusUnknown
+	}
+	warning := s.settings.Duration(model.SettingCertificateWarning)
+	if cert.WarningDays > 0 {
+		warning = time.Duration(cert.WarningDays) * 24 * time.Hour
+	}
+	critical := s.settings.Duration(model.SettingCertificateCritical)
+	if cert.CriticalDays > 0 {
+		critical = time.Duration(cert.CriticalDays) * 24 * time.Hour
+	}
+
+	left := cert.NotAfter.Sub(now)
+	switch {
+	case left <= 0:
+		return model.CertificateStatusExpired
+	case left <= critical:
+		return model.CertificateStatusCritical
+	case left <= warning:
+		return model.CertificateStatusWarning
+	default:
+		return model.CertificateStatusValid
+	}
+}
+
+// announce publishes the certificate's new status and notifies its owner
+func (s *CertificateService) announce(cert *model.Certificate, now time.Time) {
+	where := cert.Host
+	if cert.Port != 0 && cert.Port != defaultCertificatePort {
+		where = net.JoinHostPort(cert.Host, strconv.Itoa(cert.Port))
+	}
+	if cert.Source == model.CertificateSourceIngress {
+		where = fmt.Sprintf("ingress %s", cert.Name)
+	}
+	expiresAt := cert.NotAfter.UTC().Format(time.RFC3339)
+
+	var (
+		priority model.NotificationPriority
+		title    string
+		message  string
+	)
+	switch cert.Status {
+	case model.CertificateStatusExpired:
+		priority = model.NotificationPriorityCritical
+		title = fmt.Sprintf("Certificate of %s expired", cert.Name)
+		message = fmt.Sprintf("The certificate served for %s expired on %s. Renew it now.", where, expiresAt)
+	case model.CertificateStatusCritical:
+		priority = model.NotificationPriorityHigh
+		title = fmt.Sprintf("Certificate of %s expires soon", cert.Name)
+	default:
+		priority = model.NotificationPriorityMedium
+		title = fmt.Sprintf("Certificate of %s is expiring", cert.Name)
+	}
+	if message == "" {
+		message = fmt.Sprintf("The certificate served for %s expires on %s, in %s. Renew it before then.",
+			where, expiresAt, cert.NotAfter.Sub(now).Round(time.Hour))
+	}
+	if cert.Subject != "" {
+		message += fmt.Sprintf(" Subject: %s.", cert.Subject)
+	}
+
+	s.logger.Info("certificate expiring",
+		zap.String("certificateId", cert.ID.String()),
+		zap.String("status", string(cert.Status)),
+		zap.Time("expiresAt", *cert.NotAfter),
+	)
+
+	attrs := map[string]string{
+		"certificateId": cert.ID.String(),
+		"source":        string(cert.Source),
+		"status":        string(cert.Status),
+	}
+	if cert.ClusterID != nil {
+		attrs["clusterId"] = cert.ClusterID.String()
+	}
+	s.events.Publish(cert.UserID, model.EventCertificateExpiring, attrs, cert.Response(now))
+
+	if _, err := s.notifications.CreateSourcedNotification(cert.UserID, model.NotificationSourceCertificates, model.NotificationTypeSecurity, title, message, priority); err != nil {
+		s.logger.Error("failed to notify certificate expiry", zap.String("certificateId", cert.ID.String()), zap.Error(err))
+	}
+}
+
+// fetchCertificate returns the leaf certificate a TLS endpoint serves, and why
+// it is not trusted for the server name, if it is not. Untrusted certificates
+// are still returned so their expiry is tracked.
+func fetchCertificate(ctx context.Context, host string, port int, serverName string) (*x509.Certificate, string, error) {
+	if serverName == "" {
+		serverName = host
+	}
+	ctx, cancel := context.WithTimeout(ctx, certificateProbeTimeout)
+	defer cancel()
+
+	dialer := &tls.Dialer{Config: &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true, // Verified below, so expired and self-signed certificates are read too
+	}}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, "", err
+	}
+	defer conn.Close()
+
+	peers := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(peers) == 0 {
+		return nil, "", fmt.Errorf("no certificate served")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range peers[1:] {
+		intermediates.AddCert(cert)
+	}
+	verifyErr := ""
+	if _, err := peers[0].Verify(x509.VerifyOptions{DNSName: serverName, Intermediates: intermediates}); err != nil {
+		verifyErr = err.Error()
+	}
+	return peers[0], verifyErr, nil
+}
+
+// applyCertificate copies the details of an x509 certificate
+func applyCertificate(cert *model.Certificate, x *x509.Certificate) {
+	notBefore, notAfter := x.NotBefore, x.NotAfter
+	cert.Subject = x.Subject.String()
+	cert.Issuer = x.Issuer.String()
+	cert.DNSNames = strings.Join(x.DNSNames, ",")
+	cert.Serial = x.SerialNumber.Text(16)
+	cert.Fingerprint = certificateFingerprint(x)
+	cert.NotBefore = &notBefore
+	cert.NotAfter = &notAfter
+}
+
+// certificateFingerprint is the hex SHA-256 of a certificate's DER encoding
+func certificateFingerprint(x *x509.Certificate) string {
+	sum := sha256.Sum256(x.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// serverHost is the host of an API server URL
+func serverHost(server string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	if i := strings.IndexAny(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
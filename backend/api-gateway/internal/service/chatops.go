@@ -0,0 +1,662 @@
+// Package service provides ChatOps: platform commands run from Slack and
+// Microsoft Teams as the linked platform user, with their permissions
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	chatLinkCodeTTL      = 10 * time.Minute
+	chatLinkCodeLength   = 8
+	chatLinkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // No look-alike characters
+	chatAlertRefLength   = 8                                  // Characters of an alert ID commands may refer to it by
+	chatAlertListLimit   = 10
+	chatMaxSilence       = 30 * 24 * time.Hour
+	chatTaskTimeout      = 24 * time.Hour
+	chatReplyTimeout     = 10 * time.Second
+)
+
+// chatHelp lists the commands, after /myops in Slack or the webhook's mention in Teams
+const chatHelp = "Commands:\n" +
+	"`alerts list [critical|warning|info]` lists your firing alerts\n" +
+	"`ack <alert>` acknowledges an alert\n" +
+	"`silence <alert> <duration>` silences an alert, for a duration such as 30m, 2h or 1d\n" +
+	"`run-task <task> [label=value ...]` runs a copy of a batch task on its hosts, or on the hosts with the labels\n" +
+	"`link` links your chat account to your MyOps user"
+
+var (
+	// ErrInvalidChatOpsIntegration is returned for integrations that cannot be saved
+	ErrInvalidChatOpsIntegration = errors.New("invalid ChatOps integration")
+	// ErrChatOpsIntegrationNotFound is returned when the integration does not exist
+	ErrChatOpsIntegrationNotFound = errors.New("ChatOps integration not found")
+	// ErrChatOpsUnauthorized is returned for requests the integration's secret did not sign
+	ErrChatOpsUnauthorized = errors.New("invalid request signature")
+	// ErrChatLinkNotFound is returned for unknown or expired link codes and links
+	ErrChatLinkNotFound = errors.New("chat link not found")
+)
+
+// ChatOpsService runs the commands of Slack apps and Teams outgoing webhooks.
+// Each request is verified against its integration's signing secret, its chat
+// user is resolved to the platform user they linked, and the command runs with
+// that user's alerts, tasks and permissions. Every command is audited.
+type ChatOpsService struct {
+	db         *gorm.DB
+	logger     *zap.Logger
+	alerts     *AlertEngine
+	executor   *BatchTaskExecutor
+	operations *OperationService
+	http       *http.Client
+}
+
+// NewChatOpsService creates a new ChatOps service. Tasks run from chat are
+// tracked as operations.
+func NewChatOpsService(db *gorm.DB, logger *zap.Logger, alerts *AlertEngine, executor *BatchTaskExecutor, operations *OperationService) *ChatOpsService {
+	return &ChatOpsService{
+		db:         db,
+		logger:     logger,
+		alerts:     alerts,
+		executor:   executor,
+		operations: operations,
+		http:       &http.Client{Timeout: chatReplyTimeout},
+	}
+}
+
+// ============== Integrations ==============
+
+// Create validates and stores an integration
+func (s *ChatOpsService) Create(userID uuid.UUID, req *model.CreateChatOpsIntegrationRequest) (*model.ChatOpsIntegration, error) {
+	integration := &model.ChatOpsIntegration{
+		UserID:        userID,
+		Name:          req.Name,
+		Provider:      req.Provider,
+		TeamID:        req.TeamID,
+		SigningSecret: req.SigningSecret,
+		Enabled:       req.Enabled == nil || *req.Enabled,
+	}
+	if err := validateChatOpsIntegration(integration); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(integration).Error; err != nil {
+		return nil, err
+	}
+	return integration, nil
+}
+
+// List lists the user's integrations
+func (s *ChatOpsService) List(userID uuid.UUID) ([]model.ChatOpsIntegration, error) {
+	integrations := []model.ChatOpsIntegration{}
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&integrations).Error
+	return integrations, err
+}
+
+// Get gets an integration of the user
+func (s *ChatOpsService) Get(userID, id uuid.UUID) (*model.ChatOpsIntegration, error) {
+	var integration model.ChatOpsIntegration
+	err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&integration).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrChatOpsIntegrationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &integration, nil
+}
+
+// Update applies an update request to an integration. The provider cannot change.
+func (s *ChatOpsService) Update(userID, id uuid.UUID, req *model.UpdateChatOpsIntegrationRequest) (*model.ChatOpsIntegration, error) {
+	integration, err := s.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		integration.Name = *req.Name
+	}
+	if req.TeamID != nil {
+		integration.TeamID = *req.TeamID
+	}
+	if req.SigningSecret != nil {
+		integration.SigningSecret = *req.SigningSecret
+	}
+	if req.Enabled != nil {
+		integration.Enabled = *req.Enabled
+	}
+	if err := validateChatOpsIntegration(integration); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(integration).Error; err != nil {
+		return nil, err
+	}
+	return integration, nil
+}
+
+// Delete deletes an integration and its chat user links
+func (s *ChatOpsService) Delete(userID, id uuid.UUID) error {
+	integration, err := s.Get(userID, id)
+	if err != nil {
+		return err
+	}
+	return db.DeleteWithChildren(s.db, integration, "integration_id", integration.ID, &model.ChatUserLink{})
+}
+
+// validateChatOpsIntegration checks that an integration can verify its requests
+func validateChatOpsIntegration(integration *model.ChatOpsIntegration) error {
+	integration.Name = strings.TrimSpace(integration.Name)
+	integration.TeamID = strings.TrimSpace(integration.TeamID)
+	integration.SigningSecret = strings.TrimSpace(integration.SigningSecret)
+	if integration.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidChatOpsIntegration)
+	}
+	if integration.SigningSecret == "" {
+		return fmt.Errorf("%w: signing secret is required", ErrInvalidChatOpsIntegration)
+	}
+	switch integration.Provider {
+	case model.ChatProviderSlack:
+	case model.ChatProviderTeams:
+		if _, err := base64.StdEncoding.DecodeString(integration.SigningSecret); err != nil {
+			return fmt.Errorf("%w: the Teams security token must be base64", ErrInvalidChatOpsIntegration)
+		}
+	default:
+		return fmt.Errorf("%w: unknown provider %q", ErrInvalidChatOpsIntegration, integration.Provider)
+	}
+	return nil
+}
+
+// ============== Chat user links ==============
+
+// ConfirmLink links the chat account that was given code to the user
+func (s *ChatOpsService) ConfirmLink(userID uuid.UUID, code string) (*model.ChatUserLink, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return nil, ErrChatLinkNotFound
+	}
+	var link model.ChatUserLink
+	err := s.db.Where("link_code_hash = ? AND link_code_expires_at > ?", hashSecretToken(code), time.Now()).
+		First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrChatLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = s.db.Model(&link).Updates(map[string]interface{}{
+		"user_id":              userID,
+		"linked_at":            now,
+		"link_code_hash":       "",
+		"link_code_expires_at": nil,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	link.UserID, link.LinkedAt = &userID, &now
+	var integration model.ChatOpsIntegration
+	if err := s.db.Where("id = ?", link.IntegrationID).First(&integration).Error; err == nil {
+		link.Integration = &integration
+	}
+	return &link, nil
+}
+
+// Links lists the chat accounts linked to the user
+func (s *ChatOpsService) Links(userID uuid.UUID) ([]model.ChatUserLink, error) {
+	links := []model.ChatUserLink{}
+	err := s.db.Preload("Integration").Where("user_id = ?", userID).Order("linked_at DESC").Find(&links).Error
+	return links, err
+}
+
+// IntegrationLinks lists the chat accounts linked through an integration of the user
+func (s *ChatOpsService) IntegrationLinks(userID, integrationID uuid.UUID) ([]model.ChatUserLink, error) {
+	if _, err := s.Get(userID, integrationID); err != nil {
+		return nil, err
+	}
+	links := []model.ChatUserLink{}
+	err := s.db.Where("integration_id = ? AND user_id IS NOT NULL", integrationID).Order("linked_at DESC").Find(&links).Error
+	return links, err
+}
+
+// Unlink removes a link of the user's chat account, or one made through an
+// integration of the user
+func (s *ChatOpsService) Unlink(userID, linkID uuid.UUID) error {
+	var link model.ChatUserLink
+	err := s.db.Where("id = ?", linkID).First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrChatLinkNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if link.UserID == nil || *link.UserID != userID {
+		if _, err := s.Get(userID, link.IntegrationID); err != nil {
+			return ErrChatLinkNotFound
+		}
+	}
+	return s.db.Delete(&link).Error
+}
+
+// newChatLinkCode returns a short code to type, and its hash
+func newChatLinkCode() (string, string, error) {
+	raw := make([]byte, chatLinkCodeLength)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("failed to generate link code: %w", err)
+	}
+	code := make([]byte, chatLinkCodeLength)
+	for i, b := range raw {
+		code[i] = chatLinkCodeAlphabet[int(b)%len(chatLinkCodeAlphabet)]
+	}
+	return string(code), hashSecretToken(string(code)), nil
+}
+
+// ============== Commands ==============
+
+// HandleInbound verifies and runs a command or button press sent to an
+// integration, and returns the response body the chat system expects, if any
+func (s *ChatOpsService) HandleInbound(ctx context.Context, integrationID uuid.UUID, header http.Header, body []byte) (interface{}, error) {
+	var integration model.ChatOpsIntegration
+	err := s.db.Where("id = ? AND enabled = ?", integrationID, true).First(&integration).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrChatOpsIntegrationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !verifyChatSignature(&integration, header, body, time.Now()) {
+		return nil, ErrChatOpsUnauthorized
+	}
+
+	req, err := parseChatRequest(integration.Provider, body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChatOpsIntegration, err)
+	}
+	if req.Ping {
+		return nil, nil
+	}
+	if integration.TeamID != "" && req.TeamID != integration.TeamID {
+		return nil, ErrChatOpsUnauthorized
+	}
+	s.db.Model(&integration).Update("last_command_at", time.Now())
+
+	reply := s.run(&integration, req)
+	if !req.Action {
+		return renderChatReply(integration.Provider, reply), nil
+	}
+	// Slack ignores the response to a button press; replies go to its response URL
+	go s.postReply(req.ResponseURL, reply)
+	return nil, nil
+}
+
+// postReply posts the reply to a button press to Slack, below the message with the button
+func (s *ChatOpsService) postReply(responseURL string, reply *chatReply) {
+	if !slackResponseURL(responseURL) {
+		return
+	}
+	payload := renderChatReply(model.ChatProviderSlack, reply).(map[string]interface{})
+	payload["replace_original"] = false
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	resp, err := s.http.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		s.logger.Warn("failed to post chat reply", zap.Error(err))
+		return
+	}
+	resp.Body.Close()
+}
+
+// run resolves the chat user and runs their command
+func (s *ChatOpsService) run(integration *model.ChatOpsIntegration, req *chatRequest) *chatReply {
+	args := strings.Fields(req.Text)
+	if len(args) > 0 && strings.TrimPrefix(strings.ToLower(args[0]), "/") == "myops" {
+		args = args[1:]
+	}
+	if len(args) == 0 || strings.EqualFold(args[0], "help") {
+		return &chatReply{Text: chatHelp}
+	}
+	command := strings.ToLower(args[0])
+	if command == "link" {
+		return s.startLink(integration, req)
+	}
+
+	var link model.ChatUserLink
+	err := s.db.Where("integration_id = ? AND external_user_id = ? AND user_id IS NOT NULL", integration.ID, req.UserID).
+		First(&link).Error
+	if err != nil {
+		return &chatReply{Text: "Your chat account is not linked to a MyOps user. Run `link` and enter the code on the ChatOps page of MyOps."}
+	}
+	var user model.User
+	if err := s.db.Where("id = ?", *link.UserID).First(&user).Error; err != nil {
+		return &chatReply{Text: "The MyOps user your chat account is linked to no longer exists."}
+	}
+
+	cmd := &chatCommand{service: s, integration: integration, request: req, user: &user, name: command, args: args[1:]}
+	switch command {
+	case "alerts":
+		return cmd.listAlerts()
+	case "ack":
+		return cmd.acknowledge()
+	case "silence":
+		return cmd.silence()
+	case "run-task":
+		return cmd.runTask()
+	default:
+		return &chatReply{Text: fmt.Sprintf("Unknown command `%s`.\n%s", command, chatHelp)}
+	}
+}
+
+// startLink gives the chat user a code to confirm their link with while signed in
+func (s *ChatOpsService) startLink(integration *model.ChatOpsIntegration, req *chatRequest) *chatReply {
+	if req.UserID == "" {
+		return &chatReply{Text: "Your chat account could not be identified."}
+	}
+	code, hash, err := newChatLinkCode()
+	if err != nil {
+		return &chatReply{Text: "Failed to create a link code, try again."}
+	}
+	expires := time.Now().Add(chatLinkCodeTTL)
+	link := model.ChatUserLink{
+		IntegrationID:     integration.ID,
+		ExternalUserID:    req.UserID,
+		ExternalName:      req.UserName,
+		LinkCodeHash:      hash,
+		LinkCodeExpiresAt: &expires,
+	}
+	// A pending code replaces the previous one; the link itself stays until confirmed
+	err = s.db.Where(model.ChatUserLink{IntegrationID: integration.ID, ExternalUserID: req.UserID}).
+		Assign(model.ChatUserLink{ExternalName: req.UserName, LinkCodeHash: hash, LinkCodeExpiresAt: &expires}).
+		FirstOrCreate(&link).Error
+	if err != nil {
+		s.logger.Error("failed to start chat link", zap.String("integrationId", integration.ID.String()), zap.Error(err))
+		return &chatReply{Text: "Failed to create a link code, try again."}
+	}
+	return &chatReply{Text: fmt.Sprintf("Enter the code `%s` under Alerts, ChatOps in MyOps within %d minutes to run commands as your MyOps user.",
+		code, int(chatLinkCodeTTL.Minutes()))}
+}
+
+// chatCommand is a command of a linked chat user
+type chatCommand struct {
+	service     *ChatOpsService
+	integration *model.ChatOpsIntegration
+	request     *chatRequest
+	user        *model.User
+	name        string
+	args        []string
+}
+
+// allowed checks a permission of the user, auditing the command when it is denied
+func (c *chatCommand) allowed(resource, action, auditResource string) bool {
+	if model.UserHasPermission(c.service.db, c.user.ID, resource, action, nil, "").Allowed {
+		return true
+	}
+	c.audit(auditResource, "", http.StatusForbidden, fmt.Sprintf("permission %s.%s required", resource, action))
+	return false
+}
+
+func chatDenied(resource, action string) *chatReply {
+	return &chatReply{Text: fmt.Sprintf("You need the %s.%s permission to do that.", resource, action)}
+}
+
+// audit records the command as the user's, with the chat account it came from
+func (c *chatCommand) audit(resource, resourceID string, status int, errMsg string) {
+	command, _ := json.Marshal(map[string]string{
+		"command":        c.request.Text,
+		"provider":       string(c.integration.Provider),
+		"integrationId":  c.integration.ID.String(),
+		"externalUserId": c.request.UserID,
+	})
+	entry := &model.AuditLog{
+		ID:         uuid.New(),
+		UserID:     c.user.ID,
+		Username:   c.user.Username,
+		Action:     "chatops." + c.name,
+		Resource:   resource,
+		ResourceID: resourceID,
+		Method:     http.MethodPost,
+		Path:       "/api/v1/chatops/inbound/" + c.integration.ID.String(),
+		UserAgent:  "chatops/" + string(c.integration.Provider),
+		StatusCode: status,
+		ErrorMsg:   errMsg,
+		NewValue:   string(command),
+	}
+	if err := c.service.db.Create(entry).Error; err != nil {
+		c.service.logger.Error("failed to audit chat command", zap.Error(err))
+	}
+}
+
+// listAlerts lists the user's firing and silenced alerts, of a severity if given
+func (c *chatCommand) listAlerts() *chatReply {
+	args := c.args
+	if len(args) > 0 && strings.EqualFold(args[0], "list") {
+		args = args[1:]
+	}
+	if !c.allowed("alerts", "list", string(model.ResourceAlert)) {
+		return chatDenied("alerts", "list")
+	}
+
+	query := c.service.db.Model(&model.Alert{}).
+		Where("user_id = ? AND status IN ?", c.user.ID, []model.AlertStatus{model.AlertStatusFiring, model.AlertStatusSilenced})
+	if len(args) > 0 {
+		severity := model.AlertSeverity(strings.ToLower(args[0]))
+		switch severity {
+		case model.AlertSeverityCritical, model.AlertSeverityWarning, model.AlertSeverityInfo:
+			query = query.Where("severity = ?", severity)
+		default:
+			return &chatReply{Text: fmt.Sprintf("Unknown severity `%s`; use critical, warning or info.", args[0])}
+		}
+	}
+	var total int64
+	query.Count(&total)
+	var alerts []model.Alert
+	if err := query.Order("started_at DESC").Limit(chatAlertListLimit).Find(&alerts).Error; err != nil {
+		return &chatReply{Text: "Failed to list alerts, try again."}
+	}
+	c.audit(string(model.ResourceAlert), "", http.StatusOK, "")
+
+	if total == 0 {
+		return &chatReply{Text: "No alerts are firing."}
+	}
+	text := fmt.Sprintf("%d alerts are firing or silenced:", total)
+	if total > int64(len(alerts)) {
+		text = fmt.Sprintf("%d alerts are firing or silenced, the latest %d:", total, len(alerts))
+	}
+	return &chatReply{Text: text, Alerts: alerts}
+}
+
+// acknowledge acknowledges an alert of the user
+func (c *chatCommand) acknowledge() *chatReply {
+	if len(c.args) != 1 {
+		return &chatReply{Text: "Usage: `ack <alert>`"}
+	}
+	if !c.allowed("alerts", "silence", string(model.ResourceAlert)) {
+		return chatDenied("alerts", "silence")
+	}
+	alert, reply := c.alert(c.args[0])
+	if reply != nil {
+		return reply
+	}
+	if err := c.service.alerts.AcknowledgeAlert(alert, c.user.ID); err != nil {
+		c.audit(string(model.ResourceAlert), alert.ID.String(), http.StatusConflict, err.Error())
+		return &chatReply{Text: fmt.Sprintf("Could not acknowledge %s: %v", alert.Title, err)}
+	}
+	c.audit(string(model.ResourceAlert), alert.ID.String(), http.StatusOK, "")
+	return &chatReply{Text: fmt.Sprintf("%s acknowledged %s.", c.user.Username, alert.Title), Public: true}
+}
+
+// silence silences an alert of the user for a duration
+func (c *chatCommand) silence() *chatReply {
+	if len(c.args) != 2 {
+		return &chatReply{Text: "Usage: `silence <alert> <duration>`, such as `silence 1a2b3c4d 2h`"}
+	}
+	if !c.allowed("alerts", "silence", string(model.ResourceAlert)) {
+		return chatDenied("alerts", "silence")
+	}
+	duration, err := parseChatDuration(c.args[1])
+	if err != nil {
+		return &chatReply{Text: err.Error()}
+	}
+	alert, reply := c.alert(c.args[0])
+	if reply != nil {
+		return reply
+	}
+	until := time.Now().Add(duration)
+	if err := c.service.alerts.SilenceAlert(alert, until); err != nil {
+		c.audit(string(model.ResourceAlert), alert.ID.String(), http.StatusConflict, err.Error())
+		return &chatReply{Text: fmt.Sprintf("Could not silence %s: %v", alert.Title, err)}
+	}
+	c.audit(string(model.ResourceAlert), alert.ID.String(), http.StatusOK, "")
+	return &chatReply{
+		Text:   fmt.Sprintf("%s silenced %s until %s.", c.user.Username, alert.Title, until.UTC().Format("Jan 2 15:04 UTC")),
+		Public: true,
+	}
+}
+
+// alert finds an alert of the user by its ID, or the start of it
+func (c *chatCommand) alert(ref string) (*model.Alert, *chatReply) {
+	ref = strings.ToLower(ref)
+	query := c.service.db.Where("user_id = ?", c.user.ID)
+	if id, err := uuid.Parse(ref); err == nil {
+		query = query.Where("id = ?", id)
+	} else if len(ref) >= chatAlertRefLength && strings.Trim(ref, "0123456789abcdef-") == "" {
+		query = query.Where("CAST(id AS TEXT) LIKE ?", ref+"%")
+	} else {
+		return nil, &chatReply{Text: fmt.Sprintf("`%s` is not an alert ID; use the ID `alerts list` shows.", ref)}
+	}
+	var alerts []model.Alert
+	if err := query.Limit(2).Find(&alerts).Error; err != nil {
+		return nil, &chatReply{Text: "Failed to find the alert, try again."}
+	}
+	switch len(alerts) {
+	case 0:
+		return nil, &chatReply{Text: fmt.Sprintf("No alert `%s` found.", ref)}
+	case 1:
+		return &alerts[0], nil
+	default:
+		return nil, &chatReply{Text: fmt.Sprintf("More than one alert starts with `%s`; use more of its ID.", ref)}
+	}
+}
+
+// runTask runs a copy of one of the user's batch tasks, named by the first
+// argument, on the task's hosts, or on the available hosts with the labels of
+// the remaining label=value arguments
+func (c *chatCommand) runTask() *chatReply {
+	if len(c.args) == 0 {
+		return &chatReply{Text: "Usage: `run-task <task> [label=value ...]`"}
+	}
+	resource := string(model.ResourceBatchTask)
+	if !c.allowed("tasks", "run", resource) {
+		return chatDenied("tasks", "run")
+	}
+	name := c.args[0]
+	labels := map[string]string{}
+	for _, arg := range c.args[1:] {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return &chatReply{Text: fmt.Sprintf("`%s` is not a label=value host selector.", arg)}
+		}
+		labels[key] = value
+	}
+
+	gdb := c.service.db
+	var template model.BatchTask
+	if err := gdb.Where("user_id = ? AND name = ?", c.user.ID, name).Order("created_at DESC").First(&template).Error; err != nil {
+		return &chatReply{Text: fmt.Sprintf("No batch task named `%s` found.", name)}
+	}
+
+	var hostIDs []uuid.UUID
+	if len(labels) > 0 {
+		hosts, err := ResolveHostSelector(gdb, model.HostSelector{Labels: labels})
+		if err != nil {
+			return &chatReply{Text: fmt.Sprintf("Failed to find hosts: %v", err)}
+		}
+		for _, host := range hosts {
+			hostIDs = append(hostIDs, host.ID)
+		}
+	} else if err := gdb.Model(&model.BatchTaskHost{}).Where("batch_task_id = ?", template.ID).
+		Distinct().Pluck("host_id", &hostIDs).Error; err != nil {
+		return &chatReply{Text: "Failed to load the task's hosts, try again."}
+	}
+	if len(hostIDs) == 0 {
+		return &chatReply{Text: fmt.Sprintf("No available hosts to run `%s` on.", name)}
+	}
+
+	task := &model.BatchTask{
+		ID:          uuid.New(),
+		UserID:      c.user.ID,
+		Name:        fmt.Sprintf("%s (chat)", template.Name),
+		Description: fmt.Sprintf("Run from %s by %s: %s", c.integration.Name, c.request.UserName, c.request.Text),
+		Type:        template.Type,
+		Status:      model.BatchTaskStatusPending,
+		Strategy:    template.Strategy,
+		Command:     template.Command,
+		Script:      template.Script,
+		Timeout:     template.Timeout,
+		MaxRetries:  template.MaxRetries,
+		Parallelism: template.Parallelism,
+	}
+	if err := gdb.Create(task).Error; err != nil {
+		return &chatReply{Text: "Failed to create the task, try again."}
+	}
+
+	executor := c.service.executor
+	_, err := c.service.operations.Start(c.user.ID, OperationSpec{
+		Type:         model.OperationBatchTaskExecute,
+		ResourceType: "batch_task",
+		ResourceID:   &task.ID,
+		Message:      fmt.Sprintf("Running %s on %d hosts", task.Name, len(hostIDs)),
+		Cancellable:  true,
+		Timeout:      chatTaskTimeout,
+	}, func(ctx context.Context) (interface{}, error) {
+		if err := executor.ExecuteTask(ctx, task.ID, hostIDs); err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return executor.GetTaskProgress(task.ID)
+	})
+	if err != nil {
+		c.audit(resource, task.ID.String(), http.StatusInternalServerError, err.Error())
+		return &chatReply{Text: "Failed to start the task, try again."}
+	}
+	c.audit(resource, task.ID.String(), http.StatusAccepted, "")
+	return &chatReply{
+		Text:   fmt.Sprintf("%s started `%s` on %d hosts; follow it on the batch tasks page of MyOps.", c.user.Username, template.Name, len(hostIDs)),
+		Public: true,
+	}
+}
+
+// parseChatDuration parses a silence duration such as 30m, 2h or 1d
+func parseChatDuration(value string) (time.Duration, error) {
+	var duration time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		duration = time.Duration(n) * 24 * time.Hour
+	} else {
+		duration, err = time.ParseDuration(value)
+	}
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("`%s` is not a duration; use one such as 30m, 2h or 1d", value)
+	}
+	if duration > chatMaxSilence {
+		return 0, fmt.Errorf("alerts can be silenced for at most %d days", int(chatMaxSilence.Hours()/24))
+	}
+	return duration, nil
+}
@@ -0,0 +1,282 @@
+// Package service provides the Slack and Teams request formats of ChatOps integrations
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// slackSignatureTolerance bounds the age of signed Slack requests, against replays
+const slackSignatureTolerance = 5 * time.Minute
+
+// Slack action IDs of the buttons on listed alerts
+const (
+	slackActionAck     = "ack"
+	slackActionSilence = "silence"
+)
+
+// slackButtonSilence is how long the silence button silences an alert for
+const slackButtonSilence = "1h"
+
+var (
+	// teamsMentionPattern matches the mention of the outgoing webhook that starts
+	// Teams messages
+	teamsMentionPattern = regexp.MustCompile(`(?s)<at>.*?</at>`)
+	// teamsTagPattern matches the HTML Teams wraps message text in
+	teamsTagPattern = regexp.MustCompile(`<[^>]*>`)
+)
+
+// chatRequest is a command typed in chat, or a button pressed on a reply
+type chatRequest struct {
+	TeamID      string // Slack team ID, or Teams tenant ID
+	UserID      string // Slack user ID, or Azure AD object ID in Teams
+	UserName    string
+	Text        string // Command and arguments, such as "silence 1a2b3c4d 2h"
+	ResponseURL string // Where Slack takes replies to button presses
+	Action      bool   // A button press, answered at ResponseURL rather than in the response
+	Ping        bool   // A Slack check of the endpoint, answered with nothing
+}
+
+// chatReply is what a command answers with
+type chatReply struct {
+	Text   string
+	Alerts []model.Alert // Listed with ack and silence buttons in Slack
+	Public bool          // Shown to the channel rather than only the invoking user
+}
+
+// verifyChatSignature checks that a request was signed with the integration's secret
+func verifyChatSignature(integration *model.ChatOpsIntegration, header http.Header, body []byte, now time.Time) bool {
+	switch integration.Provider {
+	case model.ChatProviderSlack:
+		// https://api.slack.com/authentication/verifying-requests-from-slack
+		timestamp := header.Get("X-Slack-Request-Timestamp")
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return false
+		}
+		if age := now.Sub(time.Unix(seconds, 0)); age > slackSignatureTolerance || age < -slackSignatureTolerance {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(integration.SigningSecret))
+		mac.Write([]byte("v0:" + timestamp + ":"))
+		mac.Write(body)
+		expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature")))
+	case model.ChatProviderTeams:
+		// Outgoing webhooks sign the body with the base64 security token
+		key, err := base64.StdEncoding.DecodeString(integration.SigningSecret)
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		expected := "HMAC " + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(expected), []byte(header.Get("Authorization")))
+	default:
+		return false
+	}
+}
+
+// parseChatRequest reads the command or button press of a signed request
+func parseChatRequest(provider model.ChatProvider, body []byte) (*chatRequest, error) {
+	switch provider {
+	case model.ChatProviderSlack:
+		return parseSlackRequest(body)
+	case model.ChatProviderTeams:
+		return parseTeamsRequest(body)
+	default:
+		return nil, fmt.Errorf("unknown chat provider %q", provider)
+	}
+}
+
+// parseSlackRequest reads a slash command, or the interactivity payload of a
+// button press, both form encoded
+func parseSlackRequest(body []byte) (*chatRequest, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid form body: %w", err)
+	}
+	if form.Get("ssl_check") == "1" {
+		return &chatRequest{Ping: true}, nil
+	}
+
+	payload := form.Get("payload")
+	if payload == "" {
+		return &chatRequest{
+			TeamID:      form.Get("team_id"),
+			UserID:      form.Get("user_id"),
+			UserName:    form.Get("user_name"),
+			Text:        form.Get("text"),
+			ResponseURL: form.Get("response_url"),
+		}, nil
+	}
+
+	var interaction struct {
+		Type string `json:"type"`
+		Team struct {
+			ID string `json:"id"`
+		} `json:"team"`
+		User struct {
+			ID       string `json:"id"`
+			Username string `json:"username"`
+		} `json:"user"`
+		Actions []struct {
+			ActionID string `json:"action_id"`
+			Value    string `json:"value"`
+		} `json:"actions"`
+		ResponseURL string `json:"response_url"`
+	}
+	if err := json.Unmarshal([]byte(payload), &interaction); err != nil {
+		return nil, fmt.Errorf("invalid interactivity payload: %w", err)
+	}
+	req := &chatRequest{
+		TeamID:      interaction.Team.ID,
+		UserID:      interaction.User.ID,
+		UserName:    interaction.User.Username,
+		ResponseURL: interaction.ResponseURL,
+		Action:      true,
+	}
+	if interaction.Type != "block_actions" || len(interaction.Actions) == 0 {
+		req.Ping = true
+		return req, nil
+	}
+	action := interaction.Actions[0]
+	switch action.ActionID {
+	case slackActionAck:
+		req.Text = "ack " + action.Value
+	case slackActionSilence:
+		req.Text = "silence " + action.Value + " " + slackButtonSilence
+	default:
+		req.Ping = true
+	}
+	return req, nil
+}
+
+// parseTeamsRequest reads the message activity of an outgoing webhook, whose
+// text starts with the webhook's mention
+func parseTeamsRequest(body []byte) (*chatRequest, error) {
+	var activity struct {
+		Text string `json:"text"`
+		From struct {
+			ID          string `json:"id"`
+			Name        string `json:"name"`
+			AADObjectID string `json:"aadObjectId"`
+		} `json:"from"`
+		ChannelData struct {
+			Tenant struct {
+				ID string `json:"id"`
+			} `json:"tenant"`
+		} `json:"channelData"`
+	}
+	if err := json.Unmarshal(body, &activity); err != nil {
+		return nil, fmt.Errorf("invalid activity: %w", err)
+	}
+	userID := activity.From.AADObjectID
+	if userID == "" {
+		userID = activity.From.ID
+	}
+	text := teamsMentionPattern.ReplaceAllString(activity.Text, " ")
+	text = html.UnescapeString(teamsTagPattern.ReplaceAllString(text, " "))
+	text = strings.ReplaceAll(text, "\u00a0", " ")
+	return &chatRequest{
+		TeamID:   activity.ChannelData.Tenant.ID,
+		UserID:   userID,
+		UserName: activity.From.Name,
+		Text:     text,
+	}, nil
+}
+
+// renderChatReply formats a reply as the response body the provider expects
+func renderChatReply(provider model.ChatProvider, reply *chatReply) interface{} {
+	if provider == model.ChatProviderTeams {
+		// Outgoing webhooks cannot receive card actions, so alerts list the
+		// commands that act on them instead of buttons
+		lines := []string{reply.Text}
+		for i := range reply.Alerts {
+			alert := &reply.Alerts[i]
+			lines = append(lines, fmt.Sprintf("%s `%s` — `ack %s` or `silence %s %s`",
+				chatAlertLine(alert), chatAlertRef(alert), chatAlertRef(alert), chatAlertRef(alert), slackButtonSilence))
+		}
+		return map[string]interface{}{
+			"type": "message",
+			"text": strings.Join(lines, "\n\n"),
+		}
+	}
+
+	responseType := "ephemeral"
+	if reply.Public {
+		responseType = "in_channel"
+	}
+	blocks := []interface{}{slackSection(reply.Text)}
+	for i := range reply.Alerts {
+		alert := &reply.Alerts[i]
+		blocks = append(blocks,
+			slackSection(fmt.Sprintf("%s `%s`", chatAlertLine(alert), chatAlertRef(alert))),
+			map[string]interface{}{
+				"type": "actions",
+				"elements": []interface{}{
+					slackButton(slackActionAck, "Acknowledge", chatAlertRef(alert)),
+					slackButton(slackActionSilence, "Silence "+slackButtonSilence, chatAlertRef(alert)),
+				},
+			},
+		)
+	}
+	return map[string]interface{}{
+		"response_type": responseType,
+		"text":          reply.Text,
+		"blocks":        blocks,
+	}
+}
+
+func slackSection(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "section",
+		"text": map[string]string{"type": "mrkdwn", "text": text},
+	}
+}
+
+func slackButton(actionID, label, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "button",
+		"action_id": actionID,
+		"text":      map[string]string{"type": "plain_text", "text": label},
+		"value":     value,
+	}
+}
+
+// chatAlertLine summarizes an alert on one line
+func chatAlertLine(alert *model.Alert) string {
+	line := fmt.Sprintf("[%s] %s, since %s", alert.Severity, alert.Title, alert.StartedAt.UTC().Format("Jan 2 15:04 UTC"))
+	if alert.AcknowledgedAt != nil {
+		line += ", acknowledged"
+	}
+	if alert.Status == model.AlertStatusSilenced && alert.SilencedUntil != nil {
+		line += ", silenced until " + alert.SilencedUntil.UTC().Format("Jan 2 15:04 UTC")
+	}
+	return line
+}
+
+// chatAlertRef is the short ID commands refer to an alert by
+func chatAlertRef(alert *model.Alert) string {
+	return alert.ID.String()[:chatAlertRefLength]
+}
+
+// slackResponseURL reports whether a response URL is one of Slack's, so replies
+// to button presses are never posted elsewhere
+func slackResponseURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && u.Hostname() == "hooks.slack.com"
+}
@@ -0,0 +1,289 @@
+// Package service provides registration and inspection of Kubernetes clusters
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+)
+
+// clusterDialTimeout bounds each call made to a cluster's API server
+const clusterDialTimeout = 30 * time.Second
+
+var (
+	// ErrClusterNotFound is returned when the cluster does not exist or belongs to another user
+	ErrClusterNotFound = errors.New("cluster not found")
+	// ErrInvalidClusterConfig is returned when no client can be built from a kubeconfig
+	ErrInvalidClusterConfig = errors.New("invalid cluster config")
+	// ErrClusterUnreachable is returned when the cluster's API server cannot be reached
+	ErrClusterUnreachable = errors.New("cluster unreachable")
+)
+
+// ClusterProbe is the part of a cluster client the cluster service uses
+type ClusterProbe interface {
+	TestConnection(ctx context.Context) (*k8s.ConnectionInfo, error)
+	GetClusterInfo(ctx context.Context) (*k8s.ClusterInfo, error)
+	GetNodes(ctx context.Context) ([]k8s.NodeInfo, error)
+	Close() error
+}
+
+// ClusterDialer builds a client for a cluster's API server
+type ClusterDialer func(config *k8s.ClusterConfig) (ClusterProbe, error)
+
+// DialCluster is the ClusterDialer that connects with a k8s.ClusterClient
+func DialCluster(config *k8s.ClusterConfig) (ClusterProbe, error) {
+	client, err := k8s.NewClusterClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// ClusterService registers clusters and reads their state
+type ClusterService struct {
+	clusters ClusterRepository
+	dial     ClusterDialer
+	logger   *zap.Logger
+}
+
+// NewClusterService creates a new cluster service
+func NewClusterService(clusters ClusterRepository, dial ClusterDialer, logger *zap.Logger) *ClusterService {
+	return &ClusterService{clusters: clusters, dial: dial, logger: logger}
+}
+
+// TestConnection connects to the cluster described by a kubeconfig without storing it
+func (s *ClusterService) TestConnection(ctx context.Context, kubeconfig, endpoint string) (*k8s.ConnectionInfo, error) {
+	client, err := s.dial(&k8s.ClusterConfig{Kubeconfig: []byte(kubeconfig), Endpoint: endpoint})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidClusterConfig, err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, clusterDialTimeout)
+	defer cancel()
+	info, err := client.TestConnection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClusterUnreachable, err)
+	}
+	return info, nil
+}
+
+// Create registers a cluster once a connection to it succeeds
+func (s *ClusterService) Create(ctx context.Context, userID uuid.UUID, req *model.CreateClusterRequest) (*model.K8sCluster, error) {
+	info, err := s.TestConnection(ctx, req.Kubeconfig, req.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cluster := &model.K8sCluster{
+		ID:              uuid.New(),
+		UserID:          userID,
+		Name:            req.Name,
+		Description:     req.Description,
+		Type:            req.Type,
+		Status:          model.ClusterStatusConnected,
+		Endpoint:        req.Endpoint,
+		Kubeconfig:      req.Kubeconfig, // TODO: Encrypt this
+		Version:         info.Version,
+		NodeCount:       info.NodeCount,
+		Region:          req.Region,
+		Provider:        req.Provider,
+		LastConnectedAt: &now,
+	}
+	if err := s.clusters.Create(ctx, cluster); err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// Get returns one of the user's clusters and its Velero installation, which is
+// nil unless Velero was installed through the platform
+func (s *ClusterService) Get(ctx context.Context, id, userID uuid.UUID) (*model.K8sCluster, *model.VeleroInstallation, error) {
+	cluster, err := s.find(ctx, id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	velero, err := s.clusters.FindVeleroInstallation(ctx, cluster.ID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return nil, nil, err
+	}
+	return cluster, velero, nil
+}
+
+// List returns a page of the user's clusters and how many match the filter
+func (s *ClusterService) List(ctx context.Context, filter *db.ClusterFilter) ([]model.K8sCluster, int64, error) {
+	return s.clusters.List(ctx, filter)
+}
+
+// Update changes the non-empty fields of req. A new kubeconfig or endpoint is
+// dialed in the background to refresh the cluster's version and nodes.
+func (s *ClusterService) Update(ctx context.Context, id, userID uuid.UUID, req *model.UpdateClusterRequest) (*model.K8sCluster, error) {
+	cluster, err := s.find(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	if req.Name != "" {
+		cluster.Name = req.Name
+		fields = append(fields, "Name")
+	}
+	if req.Description != "" {
+		cluster.Description = req.Description
+		fields = append(fields, "Description")
+	}
+	if req.Endpoint != "" {
+		cluster.Endpoint = req.Endpoint
+		fields = append(fields, "Endpoint")
+	}
+	if req.Kubeconfig != "" {
+		cluster.Kubeconfig = req.Kubeconfig // TODO: Encrypt this
+		fields = append(fields, "Kubeconfig")
+	}
+	if len(fields) == 0 {
+		return cluster, nil
+	}
+	if err := s.clusters.Update(ctx, cluster, fields...); err != nil {
+		return nil, err
+	}
+
+	if req.Kubeconfig != "" || req.Endpoint != "" {
+		go s.refresh(cluster.ID)
+	}
+	return cluster, nil
+}
+
+// Delete removes one of the user's clusters with the nodes and namespaces recorded for it
+func (s *ClusterService) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	if _, err := s.find(ctx, id, userID); err != nil {
+		return err
+	}
+	return s.clusters.Delete(ctx, id)
+}
+
+// Nodes returns the nodes last read from one of the user's clusters
+func (s *ClusterService) Nodes(ctx context.Context, id, userID uuid.UUID) ([]model.ClusterNode, error) {
+	if _, err := s.find(ctx, id, userID); err != nil {
+		return nil, err
+	}
+	return s.clusters.ListNodes(ctx, id)
+}
+
+// Info reads the live version and object counts of one of the user's clusters
+func (s *ClusterService) Info(ctx context.Context, id, userID uuid.UUID) (*k8s.ClusterInfo, error) {
+	cluster, err := s.find(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.dial(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidClusterConfig, err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, clusterDialTimeout)
+	defer cancel()
+	info, err := client.GetClusterInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClusterUnreachable, err)
+	}
+	return info, nil
+}
+
+func (s *ClusterService) find(ctx context.Context, id, userID uuid.UUID) (*model.K8sCluster, error) {
+	cluster, err := s.clusters.FindOwned(ctx, id, userID)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, ErrClusterNotFound
+	}
+	return cluster, err
+}
+
+// refresh re-reads a cluster's version and nodes, recording the error on the
+// cluster when it cannot be reached
+func (s *ClusterService) refresh(clusterID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), clusterDialTimeout)
+	defer cancel()
+
+	cluster, err := s.clusters.FindByID(ctx, clusterID)
+	if err != nil {
+		return
+	}
+
+	client, err := s.dial(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		s.recordError(ctx, cluster, err)
+		return
+	}
+	defer client.Close()
+
+	info, err := client.GetClusterInfo(ctx)
+	if err != nil {
+		s.recordError(ctx, cluster, err)
+		return
+	}
+
+	now := time.Now()
+	cluster.Status = model.ClusterStatusConnected
+	cluster.Version = info.Version
+	cluster.NodeCount = info.NodeCount
+	cluster.LastConnectedAt = &now
+	cluster.ErrorMessage = ""
+	if err := s.clusters.Update(ctx, cluster, "Status", "Version", "NodeCount", "LastConnectedAt", "ErrorMessage"); err != nil {
+		s.logger.Warn("failed to record cluster info", zap.String("cluster", cluster.Name), zap.Error(err))
+		return
+	}
+
+	nodes, err := client.GetNodes(ctx)
+	if err != nil {
+		s.logger.Warn("failed to list cluster nodes", zap.String("cluster", cluster.Name), zap.Error(err))
+		return
+	}
+	if err := s.clusters.ReplaceNodes(ctx, clusterID, clusterNodes(clusterID, nodes)); err != nil {
+		s.logger.Warn("failed to record cluster nodes", zap.String("cluster", cluster.Name), zap.Error(err))
+	}
+}
+
+func (s *ClusterService) recordError(ctx context.Context, cluster *model.K8sCluster, cause error) {
+	cluster.Status = model.ClusterStatusError
+	cluster.ErrorMessage = cause.Error()
+	if err := s.clusters.Update(ctx, cluster, "Status", "ErrorMessage"); err != nil {
+		s.logger.Warn("failed to record cluster error", zap.String("cluster", cluster.Name), zap.Error(err))
+	}
+}
+
+// clusterNodes converts the nodes read from a cluster to their stored form
+func clusterNodes(clusterID uuid.UUID, nodes []k8s.NodeInfo) []model.ClusterNode {
+	out := make([]model.ClusterNode, 0, len(nodes))
+	for _, node := range nodes {
+		out = append(out, model.ClusterNode{
+			ID:                 uuid.New(),
+			ClusterID:          clusterID,
+			Name:               node.Name,
+			InternalIP:         node.InternalIP,
+			ExternalIP:         node.ExternalIP,
+			Status:             node.Status,
+			Roles:              node.Roles,
+			Version:            node.Version,
+			OSImage:            node.OSImage,
+			KernelVersion:      node.KernelVersion,
+			ContainerRuntime:   node.ContainerRuntime,
+			CPUCapacity:        node.CPUCapacity,
+			MemoryCapacity:     node.MemoryCapacity,
+			StorageCapacity:    node.StorageCapacity,
+			CPUAllocatable:     node.CPUAllocatable,
+			MemoryAllocatable:  node.MemoryAllocatable,
+			StorageAllocatable: node.StorageAllocatable,
+			Unschedulable:      node.Unschedulable,
+		})
+	}
+	return out
+}
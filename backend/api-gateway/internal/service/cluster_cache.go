@@ -0,0 +1,251 @@
+// Package service provides informer caches of connected clusters that
+// workload lists are served from
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+)
+
+// clusterCacheSweepInterval is how often idle caches and caches past their
+// object limit are dropped
+const clusterCacheSweepInterval = time.Minute
+
+// ClusterCacheOptions configures the cluster caches
+type ClusterCacheOptions struct {
+	Enabled     bool
+	Namespaces  []string      // Namespaces cached; every namespace when empty
+	MaxObjects  int           // Objects a cache may hold before it is dropped; 0 means no limit
+	IdleTimeout time.Duration // How long a cache is kept without reads
+}
+
+// ClusterCacheService keeps an informer cache of the pods, deployments and
+// services of each connected cluster it is read from, and serves workload
+// lists from it. Reads go to the cluster while a cache is cold, disabled or
+// cannot hold the cluster, and say where they were served from.
+type ClusterCacheService struct {
+	logger *zap.Logger
+	opts   ClusterCacheOptions
+
+	mu      sync.Mutex
+	caches  map[uuid.UUID]*clusterCacheEntry
+	stopped bool
+}
+
+// clusterCacheEntry is the cache of a cluster. cache is nil when the cluster
+// outgrew the limit, until retryAt.
+type clusterCacheEntry struct {
+	cache    *k8s.ClusterCache
+	client   *k8s.ClusterClient
+	config   string // Endpoint and kubeconfig the cache connected with
+	lastRead time.Time
+	retryAt  time.Time
+}
+
+func (e *clusterCacheEntry) stop() {
+	if e.cache != nil {
+		e.cache.Stop()
+		e.client.Close()
+		e.cache = nil
+	}
+}
+
+// NewClusterCacheService creates a new cluster cache service
+func NewClusterCacheService(logger *zap.Logger, opts ClusterCacheOptions) *ClusterCacheService {
+	var namespaces []string
+	for _, ns := range opts.Namespaces {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	opts.Namespaces = namespaces
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = 30 * time.Minute
+	}
+	return &ClusterCacheService{
+		logger: logger,
+		opts:   opts,
+		caches: make(map[uuid.UUID]*clusterCacheEntry),
+	}
+}
+
+// Run drops idle caches and those past their object limit until ctx is done,
+// then stops every cache
+func (s *ClusterCacheService) Run(ctx context.Context) {
+	ticker := time.NewTicker(clusterCacheSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.stopped = true
+			for id, entry := range s.caches {
+				entry.stop()
+				delete(s.caches, id)
+			}
+			s.mu.Unlock()
+			return
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+func (s *ClusterCacheService) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, entry := range s.caches {
+		switch {
+		case now.Sub(entry.lastRead) > s.opts.IdleTimeout:
+			entry.stop()
+			delete(s.caches, id)
+			s.logger.Debug("dropped idle cluster cache", zap.String("cluster_id", id.String()))
+		case entry.cache != nil && entry.cache.OverLimit():
+			// Reads go to the cluster for a while; it may have shrunk by then
+			entry.stop()
+			entry.retryAt = now.Add(s.opts.IdleTimeout)
+			s.logger.Warn("cluster has more objects than its cache may hold",
+				zap.String("cluster_id", id.String()),
+				zap.Int("max_objects", s.opts.MaxObjects))
+		}
+	}
+}
+
+// cache returns the cache of a cluster, starting it when the cluster has none.
+// It returns nil, with the freshness of a read of the cluster, when the cluster
+// is not to be cached.
+func (s *ClusterCacheService) cache(cluster *model.K8sCluster) (*k8s.ClusterCache, *k8s.CacheFreshness) {
+	if s == nil || !s.opts.Enabled || cluster.Status != model.ClusterStatusConnected {
+		return nil, k8s.CacheBypass(k8s.CacheDisabled)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return nil, k8s.CacheBypass(k8s.CacheDisabled)
+	}
+
+	now := time.Now()
+	config := cluster.Endpoint + "\n" + cluster.Kubeconfig
+	entry, ok := s.caches[cluster.ID]
+	if ok && entry.config != config {
+		// The cluster's credentials changed; cache it anew with them
+		entry.stop()
+		ok = false
+	}
+	if ok {
+		entry.lastRead = now
+		if entry.cache != nil {
+			return entry.cache, nil
+		}
+		if now.Before(entry.retryAt) {
+			return nil, k8s.CacheBypass(k8s.CacheOverLimit)
+		}
+	}
+
+	entry, err := s.start(cluster)
+	if err != nil {
+		s.logger.Warn("failed to start cluster cache",
+			zap.String("cluster_id", cluster.ID.String()), zap.Error(err))
+		delete(s.caches, cluster.ID)
+		return nil, k8s.CacheBypass(k8s.CacheDisabled)
+	}
+	entry.config = config
+	entry.lastRead = now
+	s.caches[cluster.ID] = entry
+	return entry.cache, nil
+}
+
+// start connects to a cluster and starts listing it into a new cache
+func (s *ClusterCacheService) start(cluster *model.K8sCluster) (*clusterCacheEntry, error) {
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+	cc := client.NewClusterCache(s.opts.Namespaces, s.opts.MaxObjects)
+	if err := cc.Start(); err != nil {
+		cc.Stop()
+		client.Close()
+		return nil, err
+	}
+	s.logger.Info("started cluster cache",
+		zap.String("cluster_id", cluster.ID.String()),
+		zap.Strings("namespaces", s.opts.Namespaces))
+	return &clusterCacheEntry{cache: cc, client: client}, nil
+}
+
+// Pods lists the pods of a namespace, from the cluster's cache when it can
+// serve the read and from client otherwise
+func (s *ClusterCacheService) Pods(ctx context.Context, cluster *model.K8sCluster, client *k8s.ClusterClient, namespace string) ([]k8s.PodInfo, *k8s.CacheFreshness, error) {
+	cc, freshness := s.cache(cluster)
+	if cc != nil {
+		var pods []k8s.PodInfo
+		if pods, freshness = cc.Pods(namespace); pods != nil {
+			return pods, freshness, nil
+		}
+	}
+	pods, err := client.GetPods(ctx, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pods, freshness, nil
+}
+
+// Deployments lists the deployments of a namespace, from the cluster's cache
+// when it can serve the read and from client otherwise
+func (s *ClusterCacheService) Deployments(ctx context.Context, cluster *model.K8sCluster, client *k8s.ClusterClient, namespace string) ([]k8s.DeploymentInfo, *k8s.CacheFreshness, error) {
+	cc, freshness := s.cache(cluster)
+	if cc != nil {
+		var deployments []k8s.DeploymentInfo
+		if deployments, freshness = cc.Deployments(namespace); deployments != nil {
+			return deployments, freshness, nil
+		}
+	}
+	deployments, err := client.GetDeployments(ctx, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return deployments, freshness, nil
+}
+
+// Services lists the services of a namespace, from the cluster's cache when
+// it can serve the read and from client otherwise
+func (s *ClusterCacheService) Services(ctx context.Context, cluster *model.K8sCluster, client *k8s.ClusterClient, namespace string) ([]k8s.ServiceInfo, *k8s.CacheFreshness, error) {
+	cc, freshness := s.cache(cluster)
+	if cc != nil {
+		var services []k8s.ServiceInfo
+		if services, freshness = cc.Services(namespace); services != nil {
+			return services, freshness, nil
+		}
+	}
+	services, err := client.GetServices(ctx, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return services, freshness, nil
+}
+
+// PodLabels gets the labels of a pod, from the cluster's cache when it holds
+// the pod. Pods it does not hold are looked up with client, as they may have
+// been created since its last change.
+func (s *ClusterCacheService) PodLabels(ctx context.Context, cluster *model.K8sCluster, client *k8s.ClusterClient, namespace, name string) (map[string]string, error) {
+	if cc, _ := s.cache(cluster); cc != nil {
+		if podLabels, found, _ := cc.PodLabels(namespace, name); found {
+			return podLabels, nil
+		}
+	}
+	return client.GetPodLabels(ctx, namespace, name)
+}
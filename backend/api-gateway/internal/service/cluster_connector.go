@@ -0,0 +1,399 @@
+// Package service provides onboarding of clusters through the in-cluster connector
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultConnectorNamespace = "myops-connector"
+	defaultConnectorImage     = "myops/cluster-connector:latest"
+	// connectorKeepAlive is how often the gateway pings a connector
+	connectorKeepAlive = 30 * time.Second
+	// connectorSeenInterval is how often a live tunnel's last-seen time is saved
+	connectorSeenInterval = time.Minute
+	// connectorProbeTimeout bounds the API server probe that follows a connect
+	connectorProbeTimeout = 30 * time.Second
+)
+
+var (
+	// ErrInvalidConnectorCluster is returned when a connector onboarding request is malformed
+	ErrInvalidConnectorCluster = errors.New("invalid connector cluster")
+	// ErrConnectorClusterNotFound is returned when the cluster does not exist or is not onboarded through a connector
+	ErrConnectorClusterNotFound = errors.New("connector cluster not found")
+	// ErrConnectorUnauthorized is returned when a connector presents an unknown token
+	ErrConnectorUnauthorized = errors.New("invalid connector token")
+)
+
+// ClusterConnectorService onboards clusters whose API server the platform cannot
+// dial. The cluster runs a connector that dials out to the gateway; the resulting
+// tunnel carries every ClusterClient connection to that cluster.
+type ClusterConnectorService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// NewClusterConnectorService creates a new cluster connector service
+func NewClusterConnectorService(db *gorm.DB, logger *zap.Logger) *ClusterConnectorService {
+	return &ClusterConnectorService{db: db, logger: logger}
+}
+
+// Create adds a cluster that waits for its connector and returns the manifest that
+// installs the connector. gatewayURL is used when the request does not name one.
+func (s *ClusterConnectorService) Create(userID uuid.UUID, req *model.CreateConnectorClusterRequest, gatewayURL string) (*model.ConnectorManifestResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidConnectorCluster)
+	}
+	clusterType := req.Type
+	if clusterType == "" {
+		clusterType = model.ClusterTypeSelfHosted
+	}
+	if clusterType != model.ClusterTypeManaged && clusterType != model.ClusterTypeSelfHosted {
+		return nil, fmt.Errorf("%w: unknown cluster type %q", ErrInvalidConnectorCluster, clusterType)
+	}
+	options, err := connectorOptions(&model.ConnectorManifestRequest{
+		Namespace:  req.Namespace,
+		Image:      req.Image,
+		GatewayURL: req.GatewayURL,
+	}, gatewayURL)
+	if err != nil {
+		return nil, err
+	}
+
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.New()
+	cluster := &model.K8sCluster{
+		ID:                 id,
+		UserID:             userID,
+		Name:               name,
+		Description:        req.Description,
+		Type:               clusterType,
+		Status:             model.ClusterStatusPending,
+		Endpoint:           k8s.TunnelEndpoint(id.String()),
+		Kubeconfig:         connectorKubeconfig(id),
+		Region:             req.Region,
+		Provider:           req.Provider,
+		ConnectionMode:     model.ClusterConnectionConnector,
+		ConnectorTokenHash: hash,
+	}
+	if err := s.db.Create(cluster).Error; err != nil {
+		return nil, err
+	}
+
+	return &model.ConnectorManifestResponse{
+		Cluster:  cluster,
+		Token:    token,
+		Manifest: connectorManifest(cluster, token, options),
+	}, nil
+}
+
+// Manifest generates a new connector token and the manifest that carries it. The
+// previous token stops working; a connected tunnel stays up until it reconnects.
+func (s *ClusterConnectorService) Manifest(userID, clusterID uuid.UUID, req *model.ConnectorManifestRequest, gatewayURL string) (*model.ConnectorManifestResponse, error) {
+	cluster, err := s.find(userID, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	options, err := connectorOptions(req, gatewayURL)
+	if err != nil {
+		return nil, err
+	}
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(cluster).Update("connector_token_hash", hash).Error; err != nil {
+		return nil, err
+	}
+	cluster.ConnectorTokenHash = hash
+
+	return &model.ConnectorManifestResponse{
+		Cluster:  cluster,
+		Token:    token,
+		Manifest: connectorManifest(cluster, token, options),
+	}, nil
+}
+
+// Status returns the state of a cluster's tunnel
+func (s *ClusterConnectorService) Status(userID, clusterID uuid.UUID) (*model.ClusterConnectorStatus, error) {
+	cluster, err := s.find(userID, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	status := &model.ClusterConnectorStatus{
+		Status:      string(cluster.Status),
+		Version:     cluster.ConnectorVersion,
+		Address:     cluster.ConnectorAddress,
+		ConnectedAt: cluster.ConnectorConnectedAt,
+		LastSeenAt:  cluster.ConnectorLastSeenAt,
+		Error:       cluster.ErrorMessage,
+	}
+	if session := k8s.Tunnel(cluster.ID.String()); session != nil {
+		lastSeen := session.LastSeen()
+		status.Connected = true
+		status.LastSeenAt = &lastSeen
+		status.Streams = session.Streams()
+	}
+	return status, nil
+}
+
+func (s *ClusterConnectorService) find(userID, clusterID uuid.UUID) (*model.K8sCluster, error) {
+	var cluster model.K8sCluster
+	err := s.db.Where("id = ? AND user_id = ? AND connection_mode = ?", clusterID, userID, model.ClusterConnectionConnector).
+		First(&cluster).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrConnectorClusterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cluster, nil
+}
+
+// Authenticate returns the cluster a connector token belongs to
+func (s *ClusterConnectorService) Authenticate(token string) (*model.K8sCluster, error) {
+	if token == "" {
+		return nil, ErrConnectorUnauthorized
+	}
+	var cluster model.K8sCluster
+	err := s.db.Where("connector_token_hash = ? AND connection_mode = ?", hashSecretToken(token), model.ClusterConnectionConnector).
+		First(&cluster).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrConnectorUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cluster.Status == model.ClusterStatusDisabled {
+		return nil, ErrConnectorUnauthorized
+	}
+	return &cluster, nil
+}
+
+// Serve carries a cluster's traffic over conn, the connection its connector dialed,
+// until the tunnel drops or ctx is done. A newer tunnel for the same cluster
+// replaces this one.
+func (s *ClusterConnectorService) Serve(ctx context.Context, cluster *model.K8sCluster, conn io.ReadWriteCloser, version, address string) {
+	clusterID := cluster.ID.String()
+	session := k8s.NewTunnelSession(conn)
+	k8s.RegisterTunnel(clusterID, session)
+	go session.KeepAlive(connectorKeepAlive)
+
+	now := time.Now()
+	s.db.Model(cluster).Updates(map[string]interface{}{
+		"connector_version":      version,
+		"connector_address":      address,
+		"connector_connected_at": now,
+		"connector_last_seen_at": now,
+	})
+	s.logger.Info("cluster connector connected",
+		zap.String("cluster", cluster.Name),
+		zap.String("address", address),
+		zap.String("version", version),
+	)
+	go s.probe(*cluster)
+
+	ticker := time.NewTicker(connectorSeenInterval)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case <-ticker.C:
+			s.db.Model(cluster).Update("connector_last_seen_at", session.LastSeen())
+		case <-ctx.Done():
+			session.Close()
+			done = true
+		case <-session.Done():
+			done = true
+		}
+	}
+
+	s.logger.Info("cluster connector disconnected", zap.String("cluster", cluster.Name), zap.Error(session.Err()))
+	k8s.UnregisterTunnel(clusterID, session)
+	if k8s.Tunnel(clusterID) == nil {
+		s.db.Model(cluster).Updates(map[string]interface{}{
+			"status":                 model.ClusterStatusError,
+			"error_message":          "connector disconnected",
+			"connector_last_seen_at": session.LastSeen(),
+		})
+	}
+}
+
+// probe checks the API server through a new tunnel and records the cluster as connected
+func (s *ClusterConnectorService) probe(cluster model.K8sCluster) {
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err == nil {
+		defer client.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), connectorProbeTimeout)
+		defer cancel()
+		var info *k8s.ConnectionInfo
+		if info, err = client.TestConnection(ctx); err == nil {
+			now := time.Now()
+			s.db.Model(&cluster).Updates(map[string]interface{}{
+				"status":            model.ClusterStatusConnected,
+				"error_message":     "",
+				"version":           info.Version,
+				"node_count":        info.NodeCount,
+				"last_connected_at": now,
+			})
+			return
+		}
+	}
+	s.logger.Warn("cluster connector tunnel is up but the API server is unreachable",
+		zap.String("cluster", cluster.Name), zap.Error(err))
+	s.db.Model(&cluster).Updates(map[string]interface{}{
+		"status":        model.ClusterStatusError,
+		"error_message": "connector cannot reach the API server: " + err.Error(),
+	})
+}
+
+// connectorOptions validates manifest options and applies their defaults
+func connectorOptions(req *model.ConnectorManifestRequest, gatewayURL string) (*model.ConnectorManifestRequest, error) {
+	options := &model.ConnectorManifestRequest{
+		Namespace:  strings.TrimSpace(req.Namespace),
+		Image:      strings.TrimSpace(req.Image),
+		GatewayURL: strings.TrimRight(strings.TrimSpace(req.GatewayURL), "/"),
+	}
+	if options.Namespace == "" {
+		options.Namespace = defaultConnectorNamespace
+	}
+	if options.Image == "" {
+		options.Image = defaultConnectorImage
+	}
+	if options.GatewayURL == "" {
+		options.GatewayURL = strings.TrimRight(gatewayURL, "/")
+	}
+	if !namespacePattern.MatchString(options.Namespace) {
+		return nil, fmt.Errorf("%w: namespace must be a valid Kubernetes namespace name", ErrInvalidConnectorCluster)
+	}
+	if strings.ContainsAny(options.Image, " \t\r\n\"'") {
+		return nil, fmt.Errorf("%w: invalid image", ErrInvalidConnectorCluster)
+	}
+	if u, err := url.Parse(options.GatewayURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: gatewayUrl must be an http(s) URL", ErrInvalidConnectorCluster)
+	}
+	return options, nil
+}
+
+// connectorKubeconfig is the kubeconfig stored for connector clusters. It has no
+// credentials: the connector authenticates to the API server with its own
+// service account.
+func connectorKubeconfig(clusterID uuid.UUID) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: connector
+  cluster:
+    server: %s
+users:
+- name: connector
+  user: {}
+contexts:
+- name: connector
+  context:
+    cluster: connector
+    user: connector
+current-context: connector
+`, k8s.TunnelEndpoint(clusterID.String()))
+}
+
+// connectorManifest renders the resources that run the connector. The token's hash
+// is set as a pod annotation so applying a regenerated manifest restarts the pod.
+func connectorManifest(cluster *model.K8sCluster, token string, options *model.ConnectorManifestRequest) string {
+	ns := options.Namespace
+	return fmt.Sprintf(`# myops cluster connector for %[1]q
+# Apply with: kubectl apply -f <this file>
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: %[2]s
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: myops-connector
+  namespace: %[2]s
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: myops-connector
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+subjects:
+- kind: ServiceAccount
+  name: myops-connector
+  namespace: %[2]s
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: myops-connector
+  namespace: %[2]s
+type: Opaque
+stringData:
+  gateway-url: %[3]q
+  token: %[4]q
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myops-connector
+  namespace: %[2]s
+  labels:
+    app.kubernetes.io/name: myops-connector
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: myops-connector
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: myops-connector
+      annotations:
+        myops.io/token-hash: %[5]q
+    spec:
+      serviceAccountName: myops-connector
+      containers:
+      - name: connector
+        image: %[6]s
+        env:
+        - name: MYOPS_GATEWAY_URL
+          valueFrom:
+            secretKeyRef:
+              name: myops-connector
+              key: gateway-url
+        - name: MYOPS_CONNECTOR_TOKEN
+          valueFrom:
+            secretKeyRef:
+              name: myops-connector
+              key: token
+        resources:
+          requests:
+            cpu: 10m
+            memory: 32Mi
+          limits:
+            memory: 128Mi
+`, cluster.Name, ns, options.GatewayURL, token, cluster.ConnectorTokenHash[:16], options.Image)
+}
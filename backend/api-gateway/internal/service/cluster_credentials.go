@@ -0,0 +1,367 @@
+// Package service provides expiry tracking and rotation of cluster credentials
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// clusterCredentialCheckInterval is how often stored kubeconfigs are inspected
+	clusterCredentialCheckInterval = time.Hour
+	// clusterCredentialCriticalWindow is when an expiring credential becomes critical
+	clusterCredentialCriticalWindow = 7 * 24 * time.Hour
+	// clusterCredentialTestTimeout bounds the connection tests of a rotation
+	clusterCredentialTestTimeout = 30 * time.Second
+)
+
+var (
+	// ErrInvalidClusterCredentials is returned when a kubeconfig cannot be used as a cluster's credentials
+	ErrInvalidClusterCredentials = errors.New("invalid cluster credentials")
+	// ErrClusterCredentialsNotFound is returned when the cluster does not exist or is not reached with a kubeconfig
+	ErrClusterCredentialsNotFound = errors.New("cluster not found")
+	// ErrClusterCredentialsRejected is returned when the cluster cannot be reached with new credentials
+	ErrClusterCredentialsRejected = errors.New("cluster rejected the credentials")
+	// ErrClusterCredentialsMismatch is returned when new credentials reach a different cluster
+	ErrClusterCredentialsMismatch = errors.New("credentials belong to a different cluster")
+)
+
+// clusterCredentialLevels orders the expiry levels by urgency
+var clusterCredentialLevels = map[model.CredentialExpiryLevel]int{
+	model.CredentialExpiryOK:       0,
+	model.CredentialExpiryWarning:  1,
+	model.CredentialExpiryCritical: 2,
+	model.CredentialExpiryExpired:  3,
+}
+
+// ClusterCredentialService tracks when the credentials in stored kubeconfigs expire,
+// warns cluster owners ahead of it and switches clusters over to new credentials
+type ClusterCredentialService struct {
+	db            *gorm.DB
+	logger        *zap.Logger
+	settings      *SettingsService
+	events        *EventBus
+	notifications *NotificationService
+}
+
+// NewClusterCredentialService creates a new cluster credential service
+func NewClusterCredentialService(db *gorm.DB, logger *zap.Logger, settings *SettingsService) *ClusterCredentialService {
+	return &ClusterCredentialService{
+		db:            db,
+		logger:        logger,
+		settings:      settings,
+		notifications: NewNotificationService(db, logger),
+	}
+}
+
+// SetEventBus sets the bus credential expiry events are published on
+func (s *ClusterCredentialService) SetEventBus(events *EventBus) {
+	s.events = events
+	s.notifications.SetEventBus(events)
+}
+
+// Run checks the stored credentials now and then hourly until ctx is cancelled
+func (s *ClusterCredentialService) Run(ctx context.Context) {
+	ticker := time.NewTicker(clusterCredentialCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.Check(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check inspects the kubeconfig of every cluster reached with one, records when its
+// credentials expire and warns the owner each time they reach a more urgent level
+func (s *ClusterCredentialService) Check(now time.Time) {
+	var clusters []model.K8sCluster
+	err := s.db.Where("(connection_mode IS NULL OR connection_mode <> ?) AND kubeconfig <> ''", model.ClusterConnectionConnector).
+		Find(&clusters).Error
+	if err != nil {
+		s.logger.Error("failed to load clusters for credential check", zap.Error(err))
+		return
+	}
+
+	for i := range clusters {
+		cluster := &clusters[i]
+		info, err := k8s.InspectCredentials([]byte(cluster.Kubeconfig))
+		if err != nil {
+			s.logger.Warn("failed to inspect cluster credentials",
+				zap.String("clusterId", cluster.ID.String()),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		expiresAt := credentialExpiry(info)
+		level := s.level(expiresAt, now)
+		from := cluster.CredentialExpiryLevel
+		// Only the checker that moves the level announces it, and recoveries are silent
+		result := s.db.Model(&model.K8sCluster{}).
+			Where("id = ? AND COALESCE(credential_expiry_level, '') = ?", cluster.ID, from).
+			Updates(map[string]interface{}{
+				"credential_type":         info.Type,
+				"credential_expires_at":   expiresAt,
+				"credential_checked_at":   now,
+				"credential_expiry_level": level,
+			})
+		if result.Error != nil {
+			s.logger.Error("failed to record cluster credential expiry",
+				zap.String("clusterId", cluster.ID.String()),
+				zap.Error(result.Error),
+			)
+			continue
+		}
+		if result.RowsAffected == 0 || clusterCredentialLevels[level] <= clusterCredentialLevels[from] {
+			continue
+		}
+		cluster.CredentialExpiryLevel = level
+		s.announce(cluster, info, *expiresAt, now)
+	}
+}
+
+// level returns how urgent credentials expiring at expiresAt are at now
+func (s *ClusterCredentialService) level(expiresAt *time.Time, now time.Time) model.CredentialExpiryLevel {
+	if expiresAt == nil {
+		return model.CredentialExpiryOK
+	}
+	left := expiresAt.Sub(now)
+	switch {
+	case left <= 0:
+		return model.CredentialExpiryExpired
+	case left <= clusterCredentialCriticalWindow:
+		return model.CredentialExpiryCritical
+	case left <= s.settings.Duration(model.SettingClusterCredentialWarning):
+		return model.CredentialExpiryWarning
+	default:
+		return model.CredentialExpiryOK
+	}
+}
+
+// announce records a system event for the new expiry level, publishes it and
+// notifies the cluster's owner
+func (s *ClusterCredentialService) announce(cluster *model.K8sCluster, info *k8s.CredentialInfo, expiresAt, now time.Time) {
+	what := "credentials"
+	if info.CAExpiresAt != nil && info.CAExpiresAt.Equal(expiresAt) {
+		what = "certificate authority"
+	}
+
+	var (
+		severity string
+		priority model.NotificationPriority
+		title    string
+		message  string
+	)
+	switch cluster.CredentialExpiryLevel {
+	case model.CredentialExpiryExpired:
+		severity, priority = "error", model.NotificationPriorityCritical
+		title = fmt.Sprintf("Cluster %s %s expired", cluster.Name, what)
+		message = fmt.Sprintf("The %s %s in the kubeconfig of cluster %s expired on %s. Rotate the cluster's credentials to reconnect it.",
+			info.Type, what, cluster.Name, expiresAt.UTC().Format(time.RFC3339))
+	case model.CredentialExpiryCritical:
+		severity, priority = "warning", model.NotificationPriorityHigh
+		title = fmt.Sprintf("Cluster %s %s expire soon", cluster.Name, what)
+	default:
+		severity, priority = "warning", model.NotificationPriorityMedium
+		title = fmt.Sprintf("Cluster %s %s are expiring", cluster.Name, what)
+	}
+	if message == "" {
+		message = fmt.Sprintf("The %s %s in the kubeconfig of cluster %s expire on %s, in %s. Rotate the cluster's credentials before then.",
+			info.Type, what, cluster.Name, expiresAt.UTC().Format(time.RFC3339), expiresAt.Sub(now).Round(time.Hour))
+	}
+	if info.Subject != "" {
+		message += fmt.Sprintf(" Subject: %s.", info.Subject)
+	}
+
+	metadata, _ := json.Marshal(map[string]string{
+		"level":          string(cluster.CredentialExpiryLevel),
+		"credentialType": info.Type,
+		"expiresAt":      expiresAt.UTC().Format(time.RFC3339),
+	})
+	if err := s.db.Create(&model.Event{
+		ID:        uuid.New(),
+		ClusterID: &cluster.ID,
+		Type:      "cluster_credential_expiring",
+		Severity:  severity,
+		Title:     title,
+		Message:   message,
+		Metadata:  string(metadata),
+	}).Error; err != nil {
+		s.logger.Error("failed to record cluster credential event", zap.String("clusterId", cluster.ID.String()), zap.Error(err))
+	}
+
+	s.logger.Info("cluster credentials expiring",
+		zap.String("clusterId", cluster.ID.String()),
+		zap.String("level", string(cluster.CredentialExpiryLevel)),
+		zap.Time("expiresAt", expiresAt),
+	)
+
+	s.events.Publish(cluster.UserID, model.EventClusterCredentialExpiring, map[string]string{
+		"clusterId": cluster.ID.String(),
+		"level":     string(cluster.CredentialExpiryLevel),
+	}, s.status(cluster.ID, info, now))
+
+	if _, err := s.notifications.CreateSourcedNotification(cluster.UserID, model.NotificationSourceClusters, model.NotificationTypeSecurity, title, message, priority); err != nil {
+		s.logger.Error("failed to notify cluster credential expiry", zap.String("clusterId", cluster.ID.String()), zap.Error(err))
+	}
+}
+
+// Inspect returns the credentials of a cluster's stored kubeconfig
+func (s *ClusterCredentialService) Inspect(userID, clusterID uuid.UUID) (*model.ClusterCredentialStatus, error) {
+	cluster, err := s.find(userID, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	info, err := k8s.InspectCredentials([]byte(cluster.Kubeconfig))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidClusterCredentials, err)
+	}
+	return s.status(cluster.ID, info, time.Now()), nil
+}
+
+// Rotate replaces a cluster's kubeconfig. The new credentials must reach the
+// cluster, and unless req.Force is set, the same cluster the current credentials
+// reach, before the cluster is switched over to them.
+func (s *ClusterCredentialService) Rotate(ctx context.Context, userID, clusterID uuid.UUID, req *model.RotateClusterCredentialsRequest) (*model.ClusterCredentialStatus, error) {
+	cluster, err := s.find(userID, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.Kubeconfig) == "" {
+		return nil, fmt.Errorf("%w: kubeconfig is required", ErrInvalidClusterCredentials)
+	}
+	info, err := k8s.InspectCredentials([]byte(req.Kubeconfig))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidClusterCredentials, err)
+	}
+	now := time.Now()
+	expiresAt := credentialExpiry(info)
+	if expiresAt != nil && !expiresAt.After(now) {
+		return nil, fmt.Errorf("%w: the new credentials expired on %s", ErrInvalidClusterCredentials, expiresAt.UTC().Format(time.RFC3339))
+	}
+	endpoint := cluster.Endpoint
+	if req.Endpoint != "" {
+		endpoint = req.Endpoint
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, clusterCredentialTestTimeout)
+	defer cancel()
+
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(req.Kubeconfig), Endpoint: endpoint})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidClusterCredentials, err)
+	}
+	defer client.Close()
+	connection, err := client.TestConnection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClusterCredentialsRejected, err)
+	}
+
+	if !req.Force {
+		newUID, err := client.ClusterUID(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrClusterCredentialsRejected, err)
+		}
+		// Credentials that no longer work cannot say which cluster they reached
+		if oldUID, err := clusterUID(ctx, cluster); err == nil && oldUID != newUID {
+			return nil, ErrClusterCredentialsMismatch
+		}
+	}
+
+	err = s.db.Model(&model.K8sCluster{}).Where("id = ?", cluster.ID).Updates(map[string]interface{}{
+		"kubeconfig":              req.Kubeconfig, // TODO: Encrypt this
+		"endpoint":                endpoint,
+		"status":                  model.ClusterStatusConnected,
+		"version":                 connection.Version,
+		"node_count":              connection.NodeCount,
+		"last_connected_at":       now,
+		"error_message":           "",
+		"credential_type":         info.Type,
+		"credential_expires_at":   expiresAt,
+		"credential_checked_at":   now,
+		"credential_expiry_level": model.CredentialExpiryOK,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("cluster credentials rotated",
+		zap.String("clusterId", cluster.ID.String()),
+		zap.String("userId", userID.String()),
+		zap.String("credentialType", info.Type),
+		zap.Bool("force", req.Force),
+	)
+	return s.status(cluster.ID, info, now), nil
+}
+
+// find loads a cluster of the user that is reached with a kubeconfig
+func (s *ClusterCredentialService) find(userID, clusterID uuid.UUID) (*model.K8sCluster, error) {
+	var cluster model.K8sCluster
+	err := s.db.Where("id = ? AND user_id = ? AND (connection_mode IS NULL OR connection_mode <> ?)",
+		clusterID, userID, model.ClusterConnectionConnector).First(&cluster).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrClusterCredentialsNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cluster, nil
+}
+
+// status describes inspected credentials at now
+func (s *ClusterCredentialService) status(clusterID uuid.UUID, info *k8s.CredentialInfo, now time.Time) *model.ClusterCredentialStatus {
+	status := &model.ClusterCredentialStatus{
+		ClusterID:   clusterID,
+		Context:     info.Context,
+		Server:      info.Server,
+		Type:        info.Type,
+		Subject:     info.Subject,
+		Issuer:      info.Issuer,
+		ExpiresAt:   info.ExpiresAt,
+		CAExpiresAt: info.CAExpiresAt,
+		CheckedAt:   now,
+	}
+	expiresAt := credentialExpiry(info)
+	if expiresAt != nil {
+		left := int64(expiresAt.Sub(now) / time.Second)
+		status.ExpiresIn = &left
+	}
+	status.Level = s.level(expiresAt, now)
+	return status
+}
+
+// credentialExpiry returns when the credentials or the CA expire, whichever is first
+func credentialExpiry(info *k8s.CredentialInfo) *time.Time {
+	switch {
+	case info.ExpiresAt == nil:
+		return info.CAExpiresAt
+	case info.CAExpiresAt != nil && info.CAExpiresAt.Before(*info.ExpiresAt):
+		return info.CAExpiresAt
+	default:
+		return info.ExpiresAt
+	}
+}
+
+// clusterUID identifies the cluster the stored credentials reach
+func clusterUID(ctx context.Context, cluster *model.K8sCluster) (string, error) {
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	return client.ClusterUID(ctx)
+}
@@ -0,0 +1,352 @@
+// Package service provides queries fanned out across clusters
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultFanoutTimeout = 15
+	maxFanoutTimeout     = 60
+	defaultFanoutLimit   = 1000
+	maxFanoutLimit       = 5000
+	// fanoutConcurrency is how many clusters one query reaches at a time
+	fanoutConcurrency = 8
+)
+
+// ErrInvalidFanoutQuery is returned when a fan-out query is malformed
+var ErrInvalidFanoutQuery = errors.New("invalid fan-out query")
+
+// ClusterFanoutService runs a workload or metrics query on several clusters in
+// parallel and merges the results, reporting the clusters that failed alongside them
+type ClusterFanoutService struct {
+	db        *gorm.DB
+	logger    *zap.Logger
+	collector *ClusterMetricsCollector
+}
+
+// NewClusterFanoutService creates a new cluster fan-out service
+func NewClusterFanoutService(db *gorm.DB, logger *zap.Logger, collector *ClusterMetricsCollector) *ClusterFanoutService {
+	return &ClusterFanoutService{db: db, logger: logger, collector: collector}
+}
+
+// fanoutTarget is a cluster a query runs on. visible is nil when the user may see
+// every namespace, otherwise it holds the namespaces the user is bound to.
+type fanoutTarget struct {
+	cluster model.K8sCluster
+	visible map[string]bool
+	err     error // Set when the cluster cannot be queried at all
+}
+
+// fanoutMatch is a matching item with the keys it is sorted by
+type fanoutMatch struct {
+	item     model.ClusterFanoutItem
+	restarts int32
+}
+
+// Query runs req on the requested clusters, or on every cluster the user can see
+func (s *ClusterFanoutService) Query(ctx context.Context, userID uuid.UUID, req *model.ClusterFanoutRequest) (*model.ClusterFanoutResponse, error) {
+	switch req.Resource {
+	case model.FanoutResourcePods, model.FanoutResourceDeployments, model.FanoutResourceServices,
+		model.FanoutResourceNodes, model.FanoutResourceMetrics, model.FanoutResourceImages:
+	default:
+		return nil, fmt.Errorf("%w: unknown resource %q", ErrInvalidFanoutQuery, req.Resource)
+	}
+	if req.SortBy != "" && req.SortBy != "name" && req.SortBy != "restarts" {
+		return nil, fmt.Errorf("%w: sortBy must be name or restarts", ErrInvalidFanoutQuery)
+	}
+	if req.Timeout < 0 || req.Timeout > maxFanoutTimeout {
+		return nil, fmt.Errorf("%w: timeout must be between 1 and %d seconds", ErrInvalidFanoutQuery, maxFanoutTimeout)
+	}
+	if req.Limit < 0 || req.Limit > maxFanoutLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidFanoutQuery, maxFanoutLimit)
+	}
+	timeout := time.Duration(req.Timeout) * time.Second
+	if req.Timeout == 0 {
+		timeout = defaultFanoutTimeout * time.Second
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultFanoutLimit
+	}
+
+	targets, err := s.targets(userID, req.ClusterIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]model.ClusterFanoutResult, len(targets))
+	matches := make([][]fanoutMatch, len(targets))
+	slots := make(chan struct{}, fanoutConcurrency)
+	var wg sync.WaitGroup
+	for i := range targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i], matches[i] = s.queryCluster(ctx, &targets[i], req, timeout)
+		}(i)
+	}
+	wg.Wait()
+
+	response := &model.ClusterFanoutResponse{Resource: req.Resource, Clusters: results, Items: []model.ClusterFanoutItem{}}
+	var merged []fanoutMatch
+	for i := range results {
+		if results[i].Status != model.ClusterFanoutOK {
+			response.Failed++
+		}
+		merged = append(merged, matches[i]...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		a, b := &merged[i], &merged[j]
+		if req.SortBy == "restarts" && a.restarts != b.restarts {
+			return a.restarts > b.restarts
+		}
+		if a.item.ClusterName != b.item.ClusterName {
+			return a.item.ClusterName < b.item.ClusterName
+		}
+		if a.item.Namespace != b.item.Namespace {
+			return a.item.Namespace < b.item.Namespace
+		}
+		return a.item.Name < b.item.Name
+	})
+	response.Total = len(merged)
+	if len(merged) > limit {
+		merged, response.Truncated = merged[:limit], true
+	}
+	for _, match := range merged {
+		response.Items = append(response.Items, match.item)
+	}
+	return response, nil
+}
+
+// queryCluster runs the query on one cluster within timeout
+func (s *ClusterFanoutService) queryCluster(ctx context.Context, target *fanoutTarget, req *model.ClusterFanoutRequest, timeout time.Duration) (model.ClusterFanoutResult, []fanoutMatch) {
+	cluster := &target.cluster
+	result := model.ClusterFanoutResult{ClusterID: cluster.ID, ClusterName: cluster.Name, Status: model.ClusterFanoutOK}
+	if target.err != nil {
+		result.Status, result.Error = model.ClusterFanoutError, target.err.Error()
+		return result, nil
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	matches, err := s.fetch(ctx, target, req)
+	result.Duration = time.Since(start).Milliseconds()
+	switch {
+	case err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.Status, result.Error = model.ClusterFanoutTimeout, fmt.Sprintf("no response within %s", timeout)
+	case err != nil:
+		result.Status, result.Error = model.ClusterFanoutError, err.Error()
+	}
+	if err != nil {
+		s.logger.Warn("fan-out query failed on cluster",
+			zap.String("clusterId", cluster.ID.String()),
+			zap.String("resource", string(req.Resource)),
+			zap.Error(err),
+		)
+		return result, nil
+	}
+	result.Count = len(matches)
+	return result, matches
+}
+
+// fetch lists the resource from the cluster and keeps the items matching the filter
+func (s *ClusterFanoutService) fetch(ctx context.Context, target *fanoutTarget, req *model.ClusterFanoutRequest) ([]fanoutMatch, error) {
+	cluster := &target.cluster
+	if target.visible != nil && (req.Resource == model.FanoutResourceNodes || req.Resource == model.FanoutResourceMetrics) {
+		return nil, fmt.Errorf("%s need access to the whole cluster", req.Resource)
+	}
+
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	filter := &req.Filter
+	var matches []fanoutMatch
+	add := func(namespace, name string, object interface{}, restarts int32) {
+		// Nodes and metrics are not namespaced
+		namespaced := req.Resource != model.FanoutResourceNodes && req.Resource != model.FanoutResourceMetrics
+		if namespaced && req.Namespace != "" && namespace != req.Namespace {
+			return
+		}
+		if namespaced && target.visible != nil && !target.visible[namespace] {
+			return
+		}
+		if filter.Name != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(filter.Name)) {
+			return
+		}
+		matches = append(matches, fanoutMatch{
+			item: model.ClusterFanoutItem{
+				ClusterID:   cluster.ID,
+				ClusterName: cluster.Name,
+				Namespace:   namespace,
+				Name:        name,
+				Object:      object,
+			},
+			restarts: restarts,
+		})
+	}
+
+	switch req.Resource {
+	case model.FanoutResourcePods:
+		pods, err := client.GetPods(ctx, req.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			if pod.RestartCount < filter.MinRestarts || (filter.NotReady && pod.Ready) ||
+				(filter.Status != "" && !strings.EqualFold(pod.Status, filter.Status) && !strings.EqualFold(pod.Phase, filter.Status)) {
+				continue
+			}
+			add(pod.Namespace, pod.Name, pod, pod.RestartCount)
+		}
+	case model.FanoutResourceDeployments:
+		deployments, err := client.GetDeployments(ctx, req.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, deployment := range deployments {
+			if filter.NotReady && deployment.ReadyReplicas >= deployment.Replicas {
+				continue
+			}
+			add(deployment.Namespace, deployment.Name, deployment, 0)
+		}
+	case model.FanoutResourceServices:
+		services, err := client.GetServices(ctx, req.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, svc := range services {
+			add(svc.Namespace, svc.Name, svc, 0)
+		}
+	case model.FanoutResourceImages:
+		images, err := client.ListWorkloadImages(ctx, req.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, image := range images {
+			add(image.Namespace, image.Name, image, 0)
+		}
+	case model.FanoutResourceNodes:
+		nodes, err := client.GetNodes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			if (filter.NotReady && node.Status == "Ready") || (filter.Status != "" && !strings.EqualFold(node.Status, filter.Status)) {
+				continue
+			}
+			add("", node.Name, node, 0)
+		}
+	case model.FanoutResourceMetrics:
+		if s.collector == nil {
+			return nil, errors.New("live metrics are not available")
+		}
+		live, err := s.collector.ReadLive(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		add("", cluster.Name, live, 0)
+	}
+	return matches, nil
+}
+
+// targets resolves the clusters a query runs on. Requested clusters the user cannot
+// see are reported as failed rather than rejecting the query.
+func (s *ClusterFanoutService) targets(userID uuid.UUID, ids []uuid.UUID) ([]fanoutTarget, error) {
+	var clusters []model.K8sCluster
+	if len(ids) == 0 {
+		shared := s.db.Model(&model.UserRole{}).Select("resource_id").
+			Where("user_id = ? AND resource_type = ?", userID, "cluster").
+			Where("expires_at IS NULL OR expires_at > ?", time.Now())
+		if err := s.db.Where("user_id = ? OR id IN (?)", userID, shared).Order("name").Find(&clusters).Error; err != nil {
+			return nil, err
+		}
+	} else {
+		if err := s.db.Where("id IN ?", ids).Find(&clusters).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	byID := make(map[uuid.UUID]model.K8sCluster, len(clusters))
+	for _, cluster := range clusters {
+		byID[cluster.ID] = cluster
+	}
+	order := ids
+	if len(order) == 0 {
+		for _, cluster := range clusters {
+			order = append(order, cluster.ID)
+		}
+	}
+
+	targets := make([]fanoutTarget, 0, len(order))
+	seen := make(map[uuid.UUID]bool, len(order))
+	for _, id := range order {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		cluster, ok := byID[id]
+		if !ok {
+			targets = append(targets, fanoutTarget{cluster: model.K8sCluster{ID: id}, err: errors.New("cluster not found")})
+			continue
+		}
+		target, err := s.authorize(userID, cluster)
+		if err != nil {
+			return nil, err
+		}
+		// Clusters found in the user's roles only through bindings that do not grant
+		// access are left out of "every cluster" rather than reported
+		if target.err != nil && len(ids) == 0 {
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// authorize decides what of a cluster the user may see, like the workload endpoints:
+// owners and holders of workloads.list on the cluster see all namespaces, namespace
+// bindings grant their namespaces
+func (s *ClusterFanoutService) authorize(userID uuid.UUID, cluster model.K8sCluster) (fanoutTarget, error) {
+	target := fanoutTarget{cluster: cluster}
+	if cluster.UserID == userID || model.UserHasPermission(s.db, userID, "workloads", "list", &cluster.ID, "cluster").Allowed {
+		return target, nil
+	}
+
+	var namespaces []string
+	err := s.db.Model(&model.UserRole{}).
+		Where("user_id = ? AND resource_type = ? AND resource_id = ? AND namespace <> ''", userID, "cluster", cluster.ID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Distinct().Pluck("namespace", &namespaces).Error
+	if err != nil {
+		return target, err
+	}
+	if len(namespaces) == 0 {
+		// Do not reveal clusters the user has no access to
+		return fanoutTarget{cluster: model.K8sCluster{ID: cluster.ID}, err: errors.New("cluster not found")}, nil
+	}
+	target.visible = make(map[string]bool, len(namespaces))
+	for _, namespace := range namespaces {
+		target.visible[namespace] = true
+	}
+	return target, nil
+}
@@ -0,0 +1,266 @@
+// Package service provides time-limited kubeconfigs scoped to the permissions a
+// user holds on a cluster
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultKubeconfigTTL is how long issued tokens are valid unless asked otherwise
+	defaultKubeconfigTTL = time.Hour
+	// minKubeconfigTTL is the shortest token the API server issues
+	minKubeconfigTTL = 10 * time.Minute
+	// maxKubeconfigTTL bounds how long an issued token is valid
+	maxKubeconfigTTL = 24 * time.Hour
+	// kubeconfigIssueTimeout bounds the cluster calls of issuing or revoking
+	kubeconfigIssueTimeout = 30 * time.Second
+)
+
+var (
+	// ErrInvalidKubeconfigRequest is returned for kubeconfigs that cannot be issued as asked
+	ErrInvalidKubeconfigRequest = errors.New("invalid kubeconfig request")
+	// ErrKubeconfigClusterNotFound is returned when the cluster does not exist
+	ErrKubeconfigClusterNotFound = errors.New("cluster not found")
+	// ErrNoKubeconfigPermissions is returned when the user holds no permission a
+	// kubeconfig could carry on the cluster or namespace
+	ErrNoKubeconfigPermissions = errors.New("no permissions to issue a kubeconfig for")
+	// ErrKubeconfigIssueFailed is returned when the cluster refuses the service
+	// account, role or token behind a kubeconfig
+	ErrKubeconfigIssueFailed = errors.New("failed to issue kubeconfig")
+)
+
+// kubeconfigPermission is the Kubernetes access a platform permission carries.
+// Scope is the permission's scope, namespace-scoped ones only being carried by
+// namespace kubeconfigs.
+type kubeconfigPermission struct {
+	resource string
+	action   string
+	scope    string
+	grants   []k8s.RolePermission
+}
+
+// workloadResources are the resources the workloads permissions cover
+var workloadResources = []k8s.RolePermission{
+	{Group: "apps", Resource: "deployments"},
+	{Group: "apps", Resource: "statefulsets"},
+	{Group: "apps", Resource: "daemonsets"},
+	{Group: "apps", Resource: "replicasets"},
+	{Group: "batch", Resource: "jobs"},
+	{Group: "batch", Resource: "cronjobs"},
+	{Group: "", Resource: "services"},
+}
+
+// workloadGrants grants verbs on every workload resource
+func workloadGrants(verbs ...string) []k8s.RolePermission {
+	grants := make([]k8s.RolePermission, 0, len(workloadResources))
+	for _, resource := range workloadResources {
+		resource.Verbs = verbs
+		grants = append(grants, resource)
+	}
+	return grants
+}
+
+// kubeconfigPermissions maps the platform permissions on clusters to the RBAC
+// rules of an issued kubeconfig. Other permissions have no Kubernetes equivalent.
+var kubeconfigPermissions = []kubeconfigPermission{
+	{"workloads", "list", model.PermissionScopeCluster, workloadGrants("list", "watch")},
+	{"workloads", "get", model.PermissionScopeCluster, workloadGrants("get")},
+	{"workloads", "create", model.PermissionScopeCluster, workloadGrants("create")},
+	{"workloads", "update", model.PermissionScopeCluster, append(workloadGrants("update", "patch"),
+		k8s.RolePermission{Group: "apps", Resource: "deployments/scale", Verbs: []string{"update", "patch"}},
+		k8s.RolePermission{Group: "apps", Resource: "statefulsets/scale", Verbs: []string{"update", "patch"}},
+	)},
+	{"workloads", "delete", model.PermissionScopeCluster, workloadGrants("delete")},
+	{"pods", "list", model.PermissionScopeNamespace, []k8s.RolePermission{
+		{Group: "", Resource: "pods", Verbs: []string{"list", "watch"}},
+		{Group: "", Resource: "events", Verbs: []string{"list", "watch"}},
+	}},
+	{"pods", "get", model.PermissionScopeNamespace, []k8s.RolePermission{{Group: "", Resource: "pods", Verbs: []string{"get"}}}},
+	{"pods", "logs", model.PermissionScopeNamespace, []k8s.RolePermission{{Group: "", Resource: "pods/log", Verbs: []string{"get"}}}},
+	{"pods", "terminal", model.PermissionScopeNamespace, []k8s.RolePermission{{Group: "", Resource: "pods/exec", Verbs: []string{"create", "get"}}}},
+	{"pods", "portforward", model.PermissionScopeNamespace, []k8s.RolePermission{{Group: "", Resource: "pods/portforward", Verbs: []string{"create", "get"}}}},
+	{"pods", "delete", model.PermissionScopeNamespace, []k8s.RolePermission{{Group: "", Resource: "pods", Verbs: []string{"delete"}}}},
+}
+
+// ClusterKubeconfigService issues users kubeconfigs for managed clusters that
+// authenticate as a service account bound to only the permissions the user
+// holds on the platform, so kubectl can be used without the admin kubeconfig
+type ClusterKubeconfigService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// NewClusterKubeconfigService creates a new cluster kubeconfig service
+func NewClusterKubeconfigService(db *gorm.DB, logger *zap.Logger) *ClusterKubeconfigService {
+	return &ClusterKubeconfigService{db: db, logger: logger}
+}
+
+// Issue returns a kubeconfig for the cluster carrying the user's permissions in
+// req.Namespace, or cluster-wide without one. Namespace-scoped permissions such
+// as the pods ones are only carried by namespace kubeconfigs. Issuing again
+// narrows or widens the tokens issued before to the user's current permissions.
+func (s *ClusterKubeconfigService) Issue(ctx context.Context, userID, clusterID uuid.UUID, req *model.IssueKubeconfigRequest) (*model.ScopedKubeconfig, error) {
+	if req.Namespace != "" && !namespacePattern.MatchString(req.Namespace) {
+		return nil, fmt.Errorf("%w: namespace must be a valid Kubernetes namespace name", ErrInvalidKubeconfigRequest)
+	}
+	ttl := defaultKubeconfigTTL
+	if req.TTLMinutes != 0 {
+		ttl = time.Duration(req.TTLMinutes) * time.Minute
+	}
+	if ttl < minKubeconfigTTL || ttl > maxKubeconfigTTL {
+		return nil, fmt.Errorf("%w: ttlMinutes must be between %d and %d", ErrInvalidKubeconfigRequest,
+			int(minKubeconfigTTL/time.Minute), int(maxKubeconfigTTL/time.Minute))
+	}
+
+	cluster, err := s.find(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	names, grants, err := s.permissions(userID, cluster, req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(grants) == 0 {
+		return nil, ErrNoKubeconfigPermissions
+	}
+	var user model.User
+	if err := s.db.Select("id", "username").First(&user, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKubeconfigIssueFailed, err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, kubeconfigIssueTimeout)
+	defer cancel()
+
+	access, err := client.IssueScopedAccess(ctx, &k8s.ScopedAccessRequest{
+		Name:        kubeconfigAccountName(userID, req.Namespace),
+		Namespace:   req.Namespace,
+		User:        user.Username,
+		Permissions: grants,
+		TTL:         ttl,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKubeconfigIssueFailed, err)
+	}
+	s.logger.Info("Issued scoped kubeconfig",
+		zap.String("user", user.Username),
+		zap.String("cluster", cluster.Name),
+		zap.String("namespace", req.Namespace),
+		zap.Strings("permissions", names),
+		zap.Time("expiresAt", access.ExpiresAt))
+
+	return &model.ScopedKubeconfig{
+		Kubeconfig:     string(access.Kubeconfig),
+		ServiceAccount: access.ServiceAccount,
+		Namespace:      req.Namespace,
+		Permissions:    names,
+		ExpiresAt:      access.ExpiresAt,
+	}, nil
+}
+
+// Revoke deletes the service account behind the user's kubeconfigs for the
+// cluster or namespace, invalidating them before they expire
+func (s *ClusterKubeconfigService) Revoke(ctx context.Context, userID, clusterID uuid.UUID, namespace string) error {
+	if namespace != "" && !namespacePattern.MatchString(namespace) {
+		return fmt.Errorf("%w: namespace must be a valid Kubernetes namespace name", ErrInvalidKubeconfigRequest)
+	}
+	cluster, err := s.find(clusterID)
+	if err != nil {
+		return err
+	}
+
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrKubeconfigIssueFailed, err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, kubeconfigIssueTimeout)
+	defer cancel()
+
+	if err := client.RevokeScopedAccess(ctx, kubeconfigAccountName(userID, namespace), namespace); err != nil {
+		return fmt.Errorf("%w: %v", ErrKubeconfigIssueFailed, err)
+	}
+	return nil
+}
+
+// permissions returns the platform permissions the user holds on the cluster or
+// namespace that a kubeconfig can carry, and their RBAC grants. Cluster owners
+// hold every permission. Kubernetes RBAC cannot select objects by label, so
+// permissions an access policy selects by tag for are left out.
+func (s *ClusterKubeconfigService) permissions(userID uuid.UUID, cluster *model.K8sCluster, namespace string) ([]string, []k8s.RolePermission, error) {
+	set, err := model.CachedPermissionSet(s.db, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	target := model.PermissionTarget{ResourceID: &cluster.ID, ResourceType: "cluster", ClusterID: &cluster.ID, Namespace: namespace}
+
+	var names []string
+	var grants []k8s.RolePermission
+	for _, permission := range scopeKubeconfigPermissions(namespace) {
+		if cluster.UserID != userID {
+			if !set.SuperAdmin && set.SelectsByTag(permission.resource, permission.action) {
+				continue
+			}
+			if !set.Check(permission.resource, permission.action, target).Allowed {
+				continue
+			}
+		}
+		names = append(names, permission.resource+"."+permission.action)
+		grants = append(grants, permission.grants...)
+	}
+	return names, grants, nil
+}
+
+// scopeKubeconfigPermissions returns the permissions a kubeconfig for namespace
+// can carry, leaving namespace-scoped ones out of cluster-wide kubeconfigs
+func scopeKubeconfigPermissions(namespace string) []kubeconfigPermission {
+	if namespace != "" {
+		return kubeconfigPermissions
+	}
+	permissions := make([]kubeconfigPermission, 0, len(kubeconfigPermissions))
+	for _, permission := range kubeconfigPermissions {
+		if permission.scope != model.PermissionScopeNamespace {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// find loads a cluster
+func (s *ClusterKubeconfigService) find(clusterID uuid.UUID) (*model.K8sCluster, error) {
+	var cluster model.K8sCluster
+	err := s.db.First(&cluster, "id = ?", clusterID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrKubeconfigClusterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cluster, nil
+}
+
+// kubeconfigAccountName names the service account of a user's kubeconfigs for a
+// cluster or one of its namespaces. Each scope has its own account, so a token
+// only carries the bindings of the scope it was issued for.
+func kubeconfigAccountName(userID uuid.UUID, namespace string) string {
+	sum := sha256.Sum256([]byte(userID.String() + "/" + namespace))
+	return "myops-user-" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+func TestScopeKubeconfigPermissions(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		carried   []string
+		left      []string
+	}{
+		{
+			name:    "cluster-wide",
+			carried: []string{"workloads.list", "workloads.update", "workloads.delete"},
+			left:    []string{"pods.list", "pods.terminal", "pods.portforward", "pods.delete"},
+		},
+		{
+			name:      "namespace",
+			namespace: "payments",
+			carried:   []string{"workloads.list", "pods.list", "pods.terminal", "pods.portforward", "pods.delete"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := map[string]bool{}
+			resources := map[string]bool{}
+			for _, permission := range scopeKubeconfigPermissions(tt.namespace) {
+				names[permission.resource+"."+permission.action] = true
+				for _, grant := range permission.grants {
+					resources[grant.Resource] = true
+				}
+			}
+			for _, name := range tt.carried {
+				if !names[name] {
+					t.Errorf("%s is not carried", name)
+				}
+			}
+			for _, name := range tt.left {
+				if names[name] {
+					t.Errorf("%s is carried", name)
+				}
+			}
+			if tt.namespace == "" {
+				for _, resource := range []string{"pods", "pods/exec", "pods/portforward", "pods/log"} {
+					if resources[resource] {
+						t.Errorf("cluster-wide kubeconfig grants %s", resource)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestKubeconfigPermissionScopes(t *testing.T) {
+	for _, permission := range kubeconfigPermissions {
+		want := model.PermissionScopeCluster
+		if permission.resource == "pods" {
+			want = model.PermissionScopeNamespace
+		}
+		if permission.scope != want {
+			t.Errorf("%s.%s has scope %q, want %q", permission.resource, permission.action, permission.scope, want)
+		}
+	}
+}
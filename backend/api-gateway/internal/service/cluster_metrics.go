@@ -0,0 +1,293 @@
+// Package service provides business logic for cluster metrics collection
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// clusterCollectTimeout bounds the time spent collecting one cluster
+const clusterCollectTimeout = 30 * time.Second
+
+// ClusterMetricsCollector collects metrics.k8s.io usage and kube-state-metrics object
+// states from connected clusters and persists them as time series snapshots
+type ClusterMetricsCollector struct {
+	db              *gorm.DB
+	logger          *zap.Logger
+	scrapeKubeState bool
+	settings        *SettingsService
+}
+
+// NewClusterMetricsCollector creates a new cluster metrics collector
+func NewClusterMetricsCollector(db *gorm.DB, logger *zap.Logger, scrapeKubeState bool) *ClusterMetricsCollector {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &ClusterMetricsCollector{
+		db:              db,
+		logger:          logger,
+		scrapeKubeState: scrapeKubeState,
+	}
+}
+
+// LiveClusterMetrics represents metrics read directly from a cluster
+type LiveClusterMetrics struct {
+	MetricsAvailable bool                  `json:"metricsAvailable"` // metrics-server is installed
+	Cluster          *k8s.ClusterMetrics   `json:"cluster"`
+	Nodes            []k8s.NodeMetricsData `json:"nodes"`
+	KubeState        *k8s.KubeStateMetrics `json:"kubeState,omitempty"`
+}
+
+// SetSettings sets the runtime settings the snapshot retention is read from
+func (c *ClusterMetricsCollector) SetSettings(settings *SettingsService) {
+	c.settings = settings
+}
+
+// Run collects all connected clusters every interval and prunes snapshots older than
+// retention, or than the metrics.retention setting when settings are set
+func (c *ClusterMetricsCollector) Run(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.CollectAll(ctx)
+			if c.settings != nil {
+				retention = c.settings.Duration(model.SettingMetricsRetention)
+			}
+			if retention > 0 {
+				if err := c.Prune(time.Now().Add(-retention)); err != nil {
+					c.logger.Error("failed to prune cluster metrics", zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// CollectAll collects a snapshot for every connected cluster
+func (c *ClusterMetricsCollector) CollectAll(ctx context.Context) {
+	var clusters []model.K8sCluster
+	if err := c.db.Where("status = ?", model.ClusterStatusConnected).Find(&clusters).Error; err != nil {
+		c.logger.Error("failed to list clusters for metrics collection", zap.Error(err))
+		return
+	}
+
+	for i := range clusters {
+		if err := c.CollectCluster(ctx, &clusters[i]); err != nil {
+			c.logger.Warn("cluster metrics collection failed",
+				zap.String("cluster_id", clusters[i].ID.String()),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// CollectCluster reads live metrics from a cluster and stores cluster, node and pod snapshots
+func (c *ClusterMetricsCollector) CollectCluster(ctx context.Context, cluster *model.K8sCluster) error {
+	ctx, cancel := context.WithTimeout(ctx, clusterCollectTimeout)
+	defer cancel()
+
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create cluster client: %w", err)
+	}
+	defer client.Close()
+
+	live, err := c.ReadLive(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	timestamp := live.Cluster.Timestamp.Unix()
+	clusterMetric := &model.ClusterMetric{
+		ID:               uuid.New(),
+		ClusterID:        cluster.ID,
+		Timestamp:        timestamp,
+		CPUUsagePercent:  live.Cluster.CPUUsagePercent,
+		MemoryUsageBytes: live.Cluster.MemoryUsageBytes,
+		MemoryTotalBytes: live.Cluster.MemoryTotalBytes,
+		PodCount:         live.Cluster.PodCount,
+		RunningPodCount:  live.Cluster.RunningPodCount,
+		PendingPodCount:  live.Cluster.PendingPodCount,
+		FailedPodCount:   live.Cluster.FailedPodCount,
+		NodeCount:        live.Cluster.NodeCount,
+		ReadyNodeCount:   live.Cluster.ReadyNodeCount,
+	}
+	if live.KubeState != nil {
+		clusterMetric.KubeStateAvailable = true
+		clusterMetric.DeploymentCount = live.KubeState.DeploymentCount
+		clusterMetric.UnavailableDeploymentCount = live.KubeState.UnavailableDeploymentCount
+		clusterMetric.CrashLoopPodCount = live.KubeState.CrashLoopPodCount
+		clusterMetric.FailedJobCount = live.KubeState.FailedJobCount
+	}
+
+	nodeMetrics := make([]model.NodeMetric, len(live.Nodes))
+	for i, node := range live.Nodes {
+		nodeMetrics[i] = model.NodeMetric{
+			ID:               uuid.New(),
+			ClusterID:        cluster.ID,
+			NodeName:         node.NodeName,
+			Timestamp:        timestamp,
+			CPUUsagePercent:  node.CPUUsagePercent,
+			MemoryUsageBytes: node.MemoryUsageBytes,
+			MemoryTotalBytes: node.MemoryTotalBytes,
+			DiskUsageBytes:   node.DiskUsageBytes,
+			DiskTotalBytes:   node.DiskTotalBytes,
+			PodCount:         node.PodCount,
+			Status:           node.Status,
+			Ready:            node.Ready,
+		}
+	}
+
+	// Pod usage is only available from metrics-server
+	var podMetrics []model.PodMetric
+	if live.MetricsAvailable {
+		metricsClient, err := client.MetricsClient()
+		if err == nil {
+			pods, err := metricsClient.GetPodMetrics(ctx, "")
+			if err != nil {
+				c.logger.Warn("failed to collect pod metrics", zap.String("cluster_id", cluster.ID.String()), zap.Error(err))
+			}
+
+			// Requests and labels are recorded alongside usage for cost attribution
+			resources := make(map[string]k8s.PodResources)
+			if len(pods) > 0 {
+				podResources, err := client.GetPodResources(ctx, "")
+				if err != nil {
+					c.logger.Warn("failed to collect pod requests", zap.String("cluster_id", cluster.ID.String()), zap.Error(err))
+				}
+				for _, res := range podResources {
+					resources[res.Namespace+"/"+res.PodName] = res
+				}
+			}
+
+			for _, pod := range pods {
+				res := resources[pod.Namespace+"/"+pod.PodName]
+				var labels string
+				if len(res.Labels) > 0 {
+					if data, err := json.Marshal(res.Labels); err == nil {
+						labels = string(data)
+					}
+				}
+				podMetrics = append(podMetrics, model.PodMetric{
+					ID:               uuid.New(),
+					ClusterID:        cluster.ID,
+					Namespace:        pod.Namespace,
+					PodName:          pod.PodName,
+					Timestamp:        timestamp,
+					CPUUsageCores:    pod.CPUUsageCores,
+					MemoryUsageBytes: pod.MemoryUsageBytes,
+					RestartCount:     pod.RestartCount,
+					Status:           pod.Status,
+					Ready:            pod.Ready,
+					NodeName:         pod.NodeName,
+
+					CPURequestCores:    res.CPURequestCores,
+					MemoryRequestBytes: res.MemoryRequestBytes,
+					Labels:             labels,
+				})
+			}
+		}
+	}
+
+	return c.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(clusterMetric).Error; err != nil {
+			return fmt.Errorf("failed to store cluster metric: %w", err)
+		}
+		if len(nodeMetrics) > 0 {
+			if err := tx.Create(&nodeMetrics).Error; err != nil {
+				return fmt.Errorf("failed to store node metrics: %w", err)
+			}
+		}
+		if len(podMetrics) > 0 {
+			if err := tx.CreateInBatches(&podMetrics, 500).Error; err != nil {
+				return fmt.Errorf("failed to store pod metrics: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ReadLive reads current metrics directly from the cluster. Without metrics-server only
+// object counts are returned; kube-state-metrics is scraped when enabled and installed.
+func (c *ClusterMetricsCollector) ReadLive(ctx context.Context, client *k8s.ClusterClient) (*LiveClusterMetrics, error) {
+	live := &LiveClusterMetrics{}
+
+	metricsClient, err := client.MetricsClient()
+	if err == nil {
+		live.Cluster, err = metricsClient.GetClusterMetrics(ctx)
+	}
+	if err == nil {
+		live.Nodes, err = metricsClient.GetNodeMetrics(ctx)
+	}
+
+	if err == nil {
+		live.MetricsAvailable = true
+	} else {
+		c.logger.Debug("metrics.k8s.io unavailable, falling back to object counts", zap.Error(err))
+
+		info, err := client.GetClusterInfo(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cluster info: %w", err)
+		}
+		live.Cluster = &k8s.ClusterMetrics{
+			Timestamp: time.Now(),
+			PodCount:  info.PodCount,
+			NodeCount: info.NodeCount,
+		}
+
+		nodes, err := client.GetNodes(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read nodes: %w", err)
+		}
+		live.Nodes = make([]k8s.NodeMetricsData, len(nodes))
+		for i, node := range nodes {
+			live.Nodes[i] = k8s.NodeMetricsData{
+				NodeName:  node.Name,
+				Timestamp: live.Cluster.Timestamp,
+				Status:    node.Status,
+				Ready:     node.Status == "Ready",
+			}
+			if node.Status == "Ready" {
+				live.Cluster.ReadyNodeCount++
+			}
+		}
+	}
+
+	if c.scrapeKubeState {
+		kubeState, err := client.ScrapeKubeStateMetrics(ctx)
+		if err == nil {
+			live.KubeState = kubeState
+		} else if !errors.Is(err, k8s.ErrKubeStateMetricsNotFound) {
+			c.logger.Warn("failed to scrape kube-state-metrics", zap.Error(err))
+		}
+	}
+
+	return live, nil
+}
+
+// Prune deletes metric snapshots older than before
+func (c *ClusterMetricsCollector) Prune(before time.Time) error {
+	cutoff := before.Unix()
+	for _, m := range []interface{}{&model.ClusterMetric{}, &model.NodeMetric{}, &model.PodMetric{}} {
+		if err := c.db.Where("timestamp < ?", cutoff).Delete(m).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,704 @@
+// Package service provides compliance benchmark scans of hosts and clusters
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// complianceAgentTimeout bounds a host scan by its agent
+	complianceAgentTimeout = 60 * time.Second
+	// complianceClusterTimeout bounds a cluster scan
+	complianceClusterTimeout = 2 * time.Minute
+	// complianceScheduleInterval is how often due schedules are looked for
+	complianceScheduleInterval = time.Minute
+	// compliancePruneInterval is how often expired reports are deleted
+	compliancePruneInterval = time.Hour
+	// complianceScanConcurrency is how many targets of a schedule are scanned at a time
+	complianceScanConcurrency = 4
+	// minComplianceInterval is the shortest schedule interval, in seconds
+	minComplianceInterval = 300
+)
+
+var (
+	// ErrInvalidComplianceTarget is returned for unknown target types
+	ErrInvalidComplianceTarget = errors.New("invalid compliance target")
+	// ErrComplianceTargetNotFound is returned when the host or cluster does not exist
+	ErrComplianceTargetNotFound = errors.New("compliance target not found")
+	// ErrComplianceReportNotFound is returned when the report does not exist
+	ErrComplianceReportNotFound = errors.New("compliance report not found")
+	// ErrInvalidComplianceSchedule is returned when a schedule's configuration is malformed
+	ErrInvalidComplianceSchedule = errors.New("invalid compliance schedule")
+	// ErrComplianceScheduleNotFound is returned when the schedule does not exist
+	ErrComplianceScheduleNotFound = errors.New("compliance schedule not found")
+)
+
+// ============== Check Catalog ==============
+
+// complianceHostCheck is a host check and the probe the agent evaluates for it
+type complianceHostCheck struct {
+	check model.ComplianceCheck
+	probe model.ComplianceHostProbe
+}
+
+func sshdCheck(id, section, title, severity, key, def string, expected ...string) complianceHostCheck {
+	return complianceHostCheck{
+		check: model.ComplianceCheck{ID: id, Benchmark: "CIS Linux " + section, Title: title, Severity: severity, TargetType: model.ComplianceTargetHost,
+			Remediation: fmt.Sprintf("Set %s %s in /etc/ssh/sshd_config and reload sshd", key, expected[0])},
+		probe: model.ComplianceHostProbe{ID: id, Kind: "sshd", Key: key, Default: def, Expected: expected},
+	}
+}
+
+// sshdMaxCheck checks a numeric sshd option does not exceed max
+func sshdMaxCheck(id, section, title, severity, key, def string, max int) complianceHostCheck {
+	c := sshdCheck(id, section, title, severity, key, def, fmt.Sprint(max))
+	c.probe.Expected = nil
+	c.probe.Max = &max
+	return c
+}
+
+func fileCheck(id, section, title, severity, path, maxMode string, groups ...string) complianceHostCheck {
+	return complianceHostCheck{
+		check: model.ComplianceCheck{ID: id, Benchmark: "CIS Linux " + section, Title: title, Severity: severity, TargetType: model.ComplianceTargetHost,
+			Remediation: fmt.Sprintf("chown root:%s %s && chmod %s %s", groups[0], path, strings.TrimPrefix(maxMode, "0"), path)},
+		probe: model.ComplianceHostProbe{ID: id, Kind: "file", Path: path, MaxMode: maxMode, Owner: "root", Groups: groups},
+	}
+}
+
+func sysctlCheck(id, section, title, severity, key, expected string) complianceHostCheck {
+	return complianceHostCheck{
+		check: model.ComplianceCheck{ID: id, Benchmark: "CIS Linux " + section, Title: title, Severity: severity, TargetType: model.ComplianceTargetHost,
+			Remediation: fmt.Sprintf("Set %s = %s in /etc/sysctl.d and run sysctl --system", key, expected)},
+		probe: model.ComplianceHostProbe{ID: id, Kind: "sysctl", Key: key, Expected: []string{expected}},
+	}
+}
+
+// complianceHostChecks is the subset of the CIS Linux benchmark agents evaluate
+var complianceHostChecks = []complianceHostCheck{
+	sshdCheck("host.ssh.log_level", "5.2.5", "SSH LogLevel is INFO or VERBOSE", model.ComplianceSeverityLow, "LogLevel", "INFO", "INFO", "VERBOSE"),
+	sshdCheck("host.ssh.x11_forwarding", "5.2.6", "SSH X11 forwarding is disabled", model.ComplianceSeverityLow, "X11Forwarding", "no", "no"),
+	sshdMaxCheck("host.ssh.max_auth_tries", "5.2.7", "SSH MaxAuthTries is 4 or less", model.ComplianceSeverityMedium, "MaxAuthTries", "6", 4),
+	sshdCheck("host.ssh.ignore_rhosts", "5.2.8", "SSH IgnoreRhosts is enabled", model.ComplianceSeverityMedium, "IgnoreRhosts", "yes", "yes"),
+	sshdCheck("host.ssh.hostbased_authentication", "5.2.9", "SSH host-based authentication is disabled", model.ComplianceSeverityMedium, "HostbasedAuthentication", "no", "no"),
+	sshdCheck("host.ssh.permit_root_login", "5.2.10", "SSH root login is disabled", model.ComplianceSeverityHigh, "PermitRootLogin", "prohibit-password", "no"),
+	sshdCheck("host.ssh.permit_empty_passwords", "5.2.11", "SSH empty passwords are refused", model.ComplianceSeverityHigh, "PermitEmptyPasswords", "no", "no"),
+
+	fileCheck("host.file.sshd_config", "5.2.1", "Permissions on /etc/ssh/sshd_config are configured", model.ComplianceSeverityMedium, "/etc/ssh/sshd_config", "0600", "root"),
+	fileCheck("host.file.crontab", "5.1.2", "Permissions on /etc/crontab are configured", model.ComplianceSeverityLow, "/etc/crontab", "0600", "root"),
+	fileCheck("host.file.passwd", "6.1.2", "Permissions on /etc/passwd are configured", model.ComplianceSeverityMedium, "/etc/passwd", "0644", "root"),
+	fileCheck("host.file.shadow", "6.1.3", "Permissions on /etc/shadow are configured", model.ComplianceSeverityHigh, "/etc/shadow", "0640", "root", "shadow"),
+	fileCheck("host.file.group", "6.1.4", "Permissions on /etc/group are configured", model.ComplianceSeverityMedium, "/etc/group", "0644", "root"),
+	fileCheck("host.file.gshadow", "6.1.5", "Permissions on /etc/gshadow are configured", model.ComplianceSeverityHigh, "/etc/gshadow", "0640", "root", "shadow"),
+
+	sysctlCheck("host.kernel.suid_dumpable", "1.5.1", "Core dumps of setuid programs are restricted", model.ComplianceSeverityMedium, "fs.suid_dumpable", "0"),
+	sysctlCheck("host.kernel.randomize_va_space", "1.5.3", "Address space layout randomization is enabled", model.ComplianceSeverityHigh, "kernel.randomize_va_space", "2"),
+	sysctlCheck("host.net.ip_forward", "3.1.1", "IP forwarding is disabled", model.ComplianceSeverityMedium, "net.ipv4.ip_forward", "0"),
+	sysctlCheck("host.net.send_redirects", "3.1.2", "Sending ICMP redirects is disabled", model.ComplianceSeverityMedium, "net.ipv4.conf.all.send_redirects", "0"),
+	sysctlCheck("host.net.accept_source_route", "3.2.1", "Source routed packets are refused", model.ComplianceSeverityMedium, "net.ipv4.conf.all.accept_source_route", "0"),
+	sysctlCheck("host.net.accept_redirects", "3.2.2", "ICMP redirects are refused", model.ComplianceSeverityMedium, "net.ipv4.conf.all.accept_redirects", "0"),
+	sysctlCheck("host.net.icmp_echo_ignore_broadcasts", "3.2.5", "Broadcast ICMP requests are ignored", model.ComplianceSeverityLow, "net.ipv4.icmp_echo_ignore_broadcasts", "1"),
+	sysctlCheck("host.net.tcp_syncookies", "3.2.8", "TCP SYN cookies are enabled", model.ComplianceSeverityMedium, "net.ipv4.tcp_syncookies", "1"),
+}
+
+// complianceClusterChecks describes the CIS Kubernetes Benchmark checks the
+// cluster client evaluates, in the order it reports them
+var complianceClusterChecks = []model.ComplianceCheck{
+	clusterCheck("1.2.1", "API server anonymous requests are disabled", model.ComplianceSeverityMedium, "Set --anonymous-auth=false on kube-apiserver"),
+	clusterCheck("1.2.5", "API server verifies kubelet certificates", model.ComplianceSeverityHigh, "Set --kubelet-certificate-authority on kube-apiserver"),
+	clusterCheck("1.2.6", "API server authorization mode is not AlwaysAllow", model.ComplianceSeverityHigh, "Remove AlwaysAllow from --authorization-mode on kube-apiserver"),
+	clusterCheck("1.2.7", "API server authorization mode includes Node", model.ComplianceSeverityMedium, "Add Node to --authorization-mode on kube-apiserver"),
+	clusterCheck("1.2.8", "API server authorization mode includes RBAC", model.ComplianceSeverityHigh, "Add RBAC to --authorization-mode on kube-apiserver"),
+	clusterCheck("1.2.15", "NodeRestriction admission plugin is enabled", model.ComplianceSeverityMedium, "Add NodeRestriction to --enable-admission-plugins on kube-apiserver"),
+	clusterCheck("1.2.16", "API server profiling is disabled", model.ComplianceSeverityLow, "Set --profiling=false on kube-apiserver"),
+	clusterCheck("1.2.17", "API server audit logging is enabled", model.ComplianceSeverityMedium, "Set --audit-log-path on kube-apiserver"),
+	clusterCheck("1.3.2", "Controller manager profiling is disabled", model.ComplianceSeverityLow, "Set --profiling=false on kube-controller-manager"),
+	clusterCheck("1.3.3", "Controller manager uses service account credentials", model.ComplianceSeverityMedium, "Set --use-service-account-credentials=true on kube-controller-manager"),
+	clusterCheck("1.4.1", "Scheduler profiling is disabled", model.ComplianceSeverityLow, "Set --profiling=false on kube-scheduler"),
+	clusterCheck("2.2", "etcd requires client certificates", model.ComplianceSeverityHigh, "Set --client-cert-auth=true on etcd"),
+	clusterCheck("5.1.1", "cluster-admin is only bound where required", model.ComplianceSeverityHigh, "Bind narrower roles instead of cluster-admin"),
+	clusterCheck("5.1.3", "Roles do not use wildcards", model.ComplianceSeverityMedium, "List the verbs, resources and API groups roles need"),
+	clusterCheck("5.1.5", "Default service accounts do not mount their token", model.ComplianceSeverityMedium, "Set automountServiceAccountToken: false on default service accounts"),
+	clusterCheck("5.2.1", "Namespaces enforce a Pod Security Standard", model.ComplianceSeverityMedium, "Label namespaces with pod-security.kubernetes.io/enforce"),
+	clusterCheck("5.2.2", "Privileged containers are not admitted", model.ComplianceSeverityHigh, "Remove securityContext.privileged from workloads"),
+	clusterCheck("5.2.3", "Pods do not share the host PID namespace", model.ComplianceSeverityHigh, "Remove hostPID from workloads"),
+	clusterCheck("5.2.4", "Pods do not share the host IPC namespace", model.ComplianceSeverityHigh, "Remove hostIPC from workloads"),
+	clusterCheck("5.2.5", "Pods do not share the host network", model.ComplianceSeverityMedium, "Remove hostNetwork from workloads"),
+	clusterCheck("5.3.2", "Namespaces have NetworkPolicies", model.ComplianceSeverityMedium, "Add a default deny NetworkPolicy to each namespace"),
+	clusterCheck("5.4.1", "Secrets are mounted as files rather than environment variables", model.ComplianceSeverityLow, "Mount secrets as volumes instead of secretKeyRef variables"),
+	clusterCheck("5.7.4", "The default namespace is not used", model.ComplianceSeverityLow, "Move workloads out of the default namespace"),
+}
+
+func clusterCheck(section, title, severity, remediation string) model.ComplianceCheck {
+	return model.ComplianceCheck{ID: "k8s." + section, Benchmark: "CIS Kubernetes " + section, Title: title, Severity: severity,
+		TargetType: model.ComplianceTargetCluster, Remediation: remediation}
+}
+
+// ============== Service ==============
+
+// ComplianceService scans hosts through their agents and clusters through their
+// API against a subset of the CIS benchmarks, keeps the scored reports, and runs
+// scheduled scans
+type ComplianceService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	commands *AgentCommandService
+	settings *SettingsService
+}
+
+// complianceTarget is a host or cluster to scan
+type complianceTarget struct {
+	id   uuid.UUID
+	name string
+}
+
+// NewComplianceService creates a new compliance service
+func NewComplianceService(db *gorm.DB, logger *zap.Logger, commands *AgentCommandService, settings *SettingsService) *ComplianceService {
+	return &ComplianceService{db: db, logger: logger, commands: commands, settings: settings}
+}
+
+// Checks lists the checks scans evaluate, or those of one target type
+func (s *ComplianceService) Checks(targetType model.ComplianceTargetType) []model.ComplianceCheck {
+	checks := []model.ComplianceCheck{}
+	if targetType == "" || targetType == model.ComplianceTargetHost {
+		for _, c := range complianceHostChecks {
+			checks = append(checks, c.check)
+		}
+	}
+	if targetType == "" || targetType == model.ComplianceTargetCluster {
+		checks = append(checks, complianceClusterChecks...)
+	}
+	return checks
+}
+
+// Scan scans a host or cluster now. A target that cannot be scanned, such as a
+// host whose agent is offline, gets a failed report rather than an error.
+func (s *ComplianceService) Scan(ctx context.Context, userID uuid.UUID, req *model.RunComplianceScanRequest) (*model.ComplianceReportResponse, error) {
+	target, err := s.findTarget(req.TargetType, req.TargetID)
+	if err != nil {
+		return nil, err
+	}
+	report, err := s.scan(ctx, req.TargetType, target, &userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp := report.Response()
+	return &resp, nil
+}
+
+func (s *ComplianceService) findTarget(targetType model.ComplianceTargetType, id uuid.UUID) (complianceTarget, error) {
+	var err error
+	target := complianceTarget{id: id}
+	switch targetType {
+	case model.ComplianceTargetHost:
+		var host model.Host
+		err = s.db.First(&host, "id = ?", id).Error
+		target.name = host.Hostname
+	case model.ComplianceTargetCluster:
+		var cluster model.K8sCluster
+		err = s.db.First(&cluster, "id = ?", id).Error
+		target.name = cluster.Name
+	default:
+		return target, fmt.Errorf("%w: target type must be host or cluster", ErrInvalidComplianceTarget)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return target, ErrComplianceTargetNotFound
+	}
+	return target, err
+}
+
+// scan records a running report, evaluates the target's checks and stores the results
+func (s *ComplianceService) scan(ctx context.Context, targetType model.ComplianceTargetType, target complianceTarget, userID, scheduleID *uuid.UUID) (*model.ComplianceReport, error) {
+	report := &model.ComplianceReport{
+		ID:          uuid.New(),
+		TargetType:  targetType,
+		TargetID:    target.id,
+		TargetName:  target.name,
+		ScheduleID:  scheduleID,
+		TriggeredBy: userID,
+		Status:      model.ComplianceReportRunning,
+		StartedAt:   time.Now(),
+	}
+	if err := s.db.Create(report).Error; err != nil {
+		return nil, fmt.Errorf("failed to create report: %w", err)
+	}
+
+	var results []model.ComplianceCheckResult
+	var err error
+	if targetType == model.ComplianceTargetHost {
+		results, err = s.scanHost(ctx, target.id, userID)
+	} else {
+		results, err = s.scanCluster(ctx, target.id)
+	}
+
+	now := time.Now()
+	report.CompletedAt = &now
+	if err != nil {
+		report.Status = model.ComplianceReportFailed
+		report.Error = err.Error()
+	} else {
+		scoreComplianceReport(report, results)
+	}
+	if err := s.db.Save(report).Error; err != nil {
+		return nil, fmt.Errorf("failed to save report: %w", err)
+	}
+	return report, nil
+}
+
+// scoreComplianceReport fills the counts, score and results of a completed report
+func scoreComplianceReport(report *model.ComplianceReport, results []model.ComplianceCheckResult) {
+	report.Status = model.ComplianceReportCompleted
+	for _, result := range results {
+		switch result.Status {
+		case model.CompliancePass:
+			report.Passed++
+		case model.ComplianceFail:
+			report.Failed++
+		case model.ComplianceSkipped:
+			report.Skipped++
+		default:
+			report.Errors++
+		}
+	}
+	if evaluated := report.Passed + report.Failed; evaluated > 0 {
+		report.Score = math.Round(float64(report.Passed)/float64(evaluated)*1000) / 10
+	}
+	data, _ := json.Marshal(results)
+	report.Results = string(data)
+}
+
+// scanHost has the host's agent evaluate the host checks
+func (s *ComplianceService) scanHost(ctx context.Context, hostID uuid.UUID, userID *uuid.UUID) ([]model.ComplianceCheckResult, error) {
+	var host model.Host
+	if err := s.db.First(&host, "id = ?", hostID).Error; err != nil {
+		return nil, fmt.Errorf("host not found")
+	}
+	if !AgentAvailable(&host) {
+		return nil, fmt.Errorf("agent on host %s is offline", host.Hostname)
+	}
+
+	probes := make([]model.ComplianceHostProbe, len(complianceHostChecks))
+	for i, c := range complianceHostChecks {
+		probes[i] = c.probe
+	}
+	cmd, err := s.commands.Dispatch(ctx, host.ID, userID, model.AgentCommandComplianceScan,
+		map[string]interface{}{"probes": probes}, complianceAgentTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.Status != model.AgentCommandStatusCompleted {
+		if cmd.ErrorMessage != "" {
+			return nil, fmt.Errorf("%s", cmd.ErrorMessage)
+		}
+		return nil, fmt.Errorf("command %s", cmd.Status)
+	}
+
+	var probed []model.ComplianceProbeResult
+	if err := json.Unmarshal([]byte(cmd.Output), &probed); err != nil {
+		return nil, fmt.Errorf("invalid agent output: %w", err)
+	}
+	byID := make(map[string]model.ComplianceProbeResult, len(probed))
+	for _, p := range probed {
+		byID[p.ID] = p
+	}
+
+	results := make([]model.ComplianceCheckResult, 0, len(complianceHostChecks))
+	for _, c := range complianceHostChecks {
+		result := model.ComplianceCheckResult{ComplianceCheck: c.check, Status: model.ComplianceError, Evidence: "The agent did not report this check"}
+		if p, ok := byID[c.check.ID]; ok {
+			result.Status, result.Evidence = p.Status, p.Evidence
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// scanCluster evaluates the CIS Kubernetes checks through the cluster's API
+func (s *ComplianceService) scanCluster(ctx context.Context, clusterID uuid.UUID) ([]model.ComplianceCheckResult, error) {
+	var cluster model.K8sCluster
+	if err := s.db.First(&cluster, "id = ?", clusterID).Error; err != nil {
+		return nil, fmt.Errorf("cluster not found")
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, complianceClusterTimeout)
+	defer cancel()
+	benchmark, err := client.RunBenchmark(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := make(map[string]model.ComplianceCheck, len(complianceClusterChecks))
+	for _, c := range complianceClusterChecks {
+		checks[c.ID] = c
+	}
+	results := make([]model.ComplianceCheckResult, 0, len(benchmark))
+	for _, b := range benchmark {
+		check, ok := checks["k8s."+b.ID]
+		if !ok {
+			check = clusterCheck(b.ID, "CIS Kubernetes "+b.ID, model.ComplianceSeverityMedium, "")
+		}
+		results = append(results, model.ComplianceCheckResult{
+			ComplianceCheck: check,
+			Status:          model.ComplianceCheckStatus(b.Status),
+			Evidence:        b.Evidence,
+		})
+	}
+	return results, nil
+}
+
+// ============== Reports ==============
+
+// Reports lists reports, most recent first, with the total matching the filter
+func (s *ComplianceService) Reports(filter *model.ComplianceReportFilter) ([]model.ComplianceReport, int64, error) {
+	query := s.db.Model(&model.ComplianceReport{})
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != nil {
+		query = query.Where("target_id = ?", *filter.TargetID)
+	}
+	if filter.ScheduleID != nil {
+		query = query.Where("schedule_id = ?", *filter.ScheduleID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	var reports []model.ComplianceReport
+	if err := query.Order("created_at DESC").Limit(limit).Offset(filter.Offset).Find(&reports).Error; err != nil {
+		return nil, 0, err
+	}
+	return reports, total, nil
+}
+
+// Report gets a report with its check results
+func (s *ComplianceService) Report(id uuid.UUID) (*model.ComplianceReportResponse, error) {
+	var report model.ComplianceReport
+	if err := s.db.First(&report, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrComplianceReportNotFound
+		}
+		return nil, err
+	}
+	resp := report.Response()
+	return &resp, nil
+}
+
+// Trend lists the scores of a target's completed scans since the given time,
+// oldest first
+func (s *ComplianceService) Trend(targetType model.ComplianceTargetType, targetID uuid.UUID, since time.Time) ([]model.ComplianceTrendPoint, error) {
+	var reports []model.ComplianceReport
+	err := s.db.Select("id, created_at, score, passed, failed").
+		Where("target_type = ? AND target_id = ? AND status = ? AND created_at >= ?", targetType, targetID, model.ComplianceReportCompleted, since).
+		Order("created_at").
+		Find(&reports).Error
+	if err != nil {
+		return nil, err
+	}
+	points := make([]model.ComplianceTrendPoint, len(reports))
+	for i, r := range reports {
+		points[i] = model.ComplianceTrendPoint{ReportID: r.ID, Timestamp: r.CreatedAt, Score: r.Score, Passed: r.Passed, Failed: r.Failed}
+	}
+	return points, nil
+}
+
+// ============== Schedules ==============
+
+// ListSchedules lists the scan schedules
+func (s *ComplianceService) ListSchedules() ([]model.ComplianceScheduleResponse, error) {
+	var schedules []model.ComplianceSchedule
+	if err := s.db.Order("name").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	resp := make([]model.ComplianceScheduleResponse, len(schedules))
+	for i := range schedules {
+		resp[i] = schedules[i].Response()
+	}
+	return resp, nil
+}
+
+// GetSchedule gets a scan schedule
+func (s *ComplianceService) GetSchedule(id uuid.UUID) (*model.ComplianceScheduleResponse, error) {
+	schedule, err := s.findSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	resp := schedule.Response()
+	return &resp, nil
+}
+
+func (s *ComplianceService) findSchedule(id uuid.UUID) (*model.ComplianceSchedule, error) {
+	var schedule model.ComplianceSchedule
+	if err := s.db.First(&schedule, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrComplianceScheduleNotFound
+		}
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// CreateSchedule adds a schedule whose first scan runs one interval from now
+func (s *ComplianceService) CreateSchedule(userID uuid.UUID, req *model.CreateComplianceScheduleRequest) (*model.ComplianceScheduleResponse, error) {
+	schedule := &model.ComplianceSchedule{
+		Name:       strings.TrimSpace(req.Name),
+		TargetType: req.TargetType,
+		Interval:   req.Interval,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+		CreatedBy:  userID,
+		NextRunAt:  time.Now().Add(time.Duration(req.Interval) * time.Second),
+	}
+	if err := s.setScheduleTargets(schedule, req.TargetIDs); err != nil {
+		return nil, err
+	}
+	if err := validateComplianceSchedule(schedule); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(schedule).Error; err != nil {
+		return nil, err
+	}
+	resp := schedule.Response()
+	return &resp, nil
+}
+
+// UpdateSchedule changes the given fields of a schedule. A new interval counts
+// from the schedule's last run.
+func (s *ComplianceService) UpdateSchedule(id uuid.UUID, req *model.UpdateComplianceScheduleRequest) (*model.ComplianceScheduleResponse, error) {
+	schedule, err := s.findSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		schedule.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.TargetIDs != nil {
+		if err := s.setScheduleTargets(schedule, *req.TargetIDs); err != nil {
+			return nil, err
+		}
+	}
+	if req.Interval != nil {
+		schedule.Interval = *req.Interval
+		from := schedule.CreatedAt
+		if schedule.LastRunAt != nil {
+			from = *schedule.LastRunAt
+		}
+		schedule.NextRunAt = from.Add(time.Duration(schedule.Interval) * time.Second)
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+	if err := validateComplianceSchedule(schedule); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(schedule).Error; err != nil {
+		return nil, err
+	}
+	resp := schedule.Response()
+	return &resp, nil
+}
+
+// DeleteSchedule removes a schedule; its reports are kept
+func (s *ComplianceService) DeleteSchedule(id uuid.UUID) error {
+	result := s.db.Delete(&model.ComplianceSchedule{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrComplianceScheduleNotFound
+	}
+	return nil
+}
+
+// setScheduleTargets checks the targets exist and stores them as JSON
+func (s *ComplianceService) setScheduleTargets(schedule *model.ComplianceSchedule, ids []uuid.UUID) error {
+	for _, id := range ids {
+		if _, err := s.findTarget(schedule.TargetType, id); err != nil {
+			if errors.Is(err, ErrComplianceTargetNotFound) {
+				return fmt.Errorf("%w: %s %s not found", ErrInvalidComplianceSchedule, schedule.TargetType, id)
+			}
+			return err
+		}
+	}
+	schedule.TargetIDs = ""
+	if len(ids) > 0 {
+		data, _ := json.Marshal(ids)
+		schedule.TargetIDs = string(data)
+	}
+	return nil
+}
+
+func validateComplianceSchedule(schedule *model.ComplianceSchedule) error {
+	if schedule.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidComplianceSchedule)
+	}
+	if schedule.TargetType != model.ComplianceTargetHost && schedule.TargetType != model.ComplianceTargetCluster {
+		return fmt.Errorf("%w: target type must be host or cluster", ErrInvalidComplianceSchedule)
+	}
+	if schedule.Interval < minComplianceInterval {
+		return fmt.Errorf("%w: interval must be at least %d seconds", ErrInvalidComplianceSchedule, minComplianceInterval)
+	}
+	return nil
+}
+
+// ============== Scheduled Scans ==============
+
+// Run scans the targets of due schedules every minute and prunes expired
+// reports every hour until ctx is done
+func (s *ComplianceService) Run(ctx context.Context) {
+	ticker := time.NewTicker(complianceScheduleInterval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		s.runDue(ctx)
+		if time.Since(lastPrune) >= compliancePruneInterval {
+			lastPrune = time.Now()
+			if deleted, err := s.Prune(); err != nil {
+				s.logger.Error("failed to prune compliance reports", zap.Error(err))
+			} else if deleted > 0 {
+				s.logger.Info("pruned compliance reports", zap.Int64("deleted", deleted))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDue scans the targets of every enabled schedule whose next run has come.
+// A schedule is claimed by moving its next run, so each run happens once even
+// with several gateway replicas.
+func (s *ComplianceService) runDue(ctx context.Context) {
+	var due []model.ComplianceSchedule
+	if err := s.db.Where("enabled = ? AND next_run_at <= ?", true, time.Now()).Find(&due).Error; err != nil {
+		s.logger.Error("failed to load compliance schedules", zap.Error(err))
+		return
+	}
+
+	for i := range due {
+		schedule := &due[i]
+		now := time.Now()
+		claim := s.db.Model(&model.ComplianceSchedule{}).
+			Where("id = ? AND next_run_at = ?", schedule.ID, schedule.NextRunAt).
+			Updates(map[string]interface{}{
+				"last_run_at": now,
+				"next_run_at": now.Add(time.Duration(schedule.Interval) * time.Second),
+			})
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+
+		targets, err := s.scheduleTargets(schedule)
+		if err != nil {
+			s.logger.Error("failed to resolve compliance schedule targets", zap.String("schedule", schedule.Name), zap.Error(err))
+			continue
+		}
+		s.scanTargets(ctx, schedule, targets)
+	}
+}
+
+// scheduleTargets returns the schedule's targets, or every approved host or every
+// connected cluster when it names none. Targets deleted since are left out.
+func (s *ComplianceService) scheduleTargets(schedule *model.ComplianceSchedule) ([]complianceTarget, error) {
+	ids := schedule.Response().TargetIDs
+	var targets []complianceTarget
+
+	if schedule.TargetType == model.ComplianceTargetHost {
+		var hosts []model.Host
+		query := s.db.Select("id, hostname")
+		if len(ids) > 0 {
+			query = query.Where("id IN ?", ids)
+		} else {
+			query = query.Where("status IN ?", []model.HostStatus{model.HostStatusApproved, model.HostStatusOnline, model.HostStatusDegraded})
+		}
+		if err := query.Find(&hosts).Error; err != nil {
+			return nil, err
+		}
+		for _, h := range hosts {
+			targets = append(targets, complianceTarget{id: h.ID, name: h.Hostname})
+		}
+		return targets, nil
+	}
+
+	var clusters []model.K8sCluster
+	query := s.db.Select("id, name")
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	} else {
+		query = query.Where("status = ?", model.ClusterStatusConnected)
+	}
+	if err := query.Find(&clusters).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range clusters {
+		targets = append(targets, complianceTarget{id: c.ID, name: c.Name})
+	}
+	return targets, nil
+}
+
+func (s *ComplianceService) scanTargets(ctx context.Context, schedule *model.ComplianceSchedule, targets []complianceTarget) {
+	sem := make(chan struct{}, complianceScanConcurrency)
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(target complianceTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			report, err := s.scan(ctx, schedule.TargetType, target, nil, &schedule.ID)
+			if err != nil {
+				s.logger.Error("failed to run scheduled compliance scan",
+					zap.String("schedule", schedule.Name), zap.String("target", target.name), zap.Error(err))
+				return
+			}
+			if report.Status == model.ComplianceReportFailed {
+				s.logger.Warn("scheduled compliance scan failed",
+					zap.String("schedule", schedule.Name), zap.String("target", target.name), zap.String("error", report.Error))
+			}
+		}(target)
+	}
+	wg.Wait()
+}
+
+// Prune deletes reports older than the retention setting and returns the number deleted
+func (s *ComplianceService) Prune() (int64, error) {
+	retention := s.settings.Duration(model.SettingComplianceRetention)
+	if retention <= 0 {
+		return 0, nil
+	}
+	result := s.db.Where("created_at < ?", time.Now().Add(-retention)).Delete(&model.ComplianceReport{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,153 @@
+// Package service provides CSV and PDF exports of compliance reports
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+const (
+	// pdfLinesPerPage and pdfLineWidth lay out report text on A4 pages in 9pt Courier
+	pdfLinesPerPage = 60
+	pdfLineWidth    = 100
+)
+
+// ExportComplianceCSV writes a report's check results as CSV, one row per check
+func ExportComplianceCSV(report *model.ComplianceReportResponse) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"target", "check", "benchmark", "title", "severity", "status", "evidence", "remediation"})
+	for _, r := range report.Results {
+		w.Write([]string{report.TargetName, r.ID, r.Benchmark, r.Title, r.Severity, string(r.Status), r.Evidence, r.Remediation})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// ExportCompliancePDF renders a report as a plain text PDF
+func ExportCompliancePDF(report *model.ComplianceReportResponse) []byte {
+	lines := []string{
+		fmt.Sprintf("Compliance report: %s %s", report.TargetType, report.TargetName),
+		fmt.Sprintf("Scanned at %s", report.StartedAt.UTC().Format(time.RFC3339)),
+		fmt.Sprintf("Status: %s", report.Status),
+	}
+	if report.Status == model.ComplianceReportFailed {
+		lines = append(lines, "Error: "+report.Error)
+	} else {
+		lines = append(lines,
+			fmt.Sprintf("Score: %.1f%%", report.Score),
+			fmt.Sprintf("Passed %d, failed %d, skipped %d, errors %d", report.Passed, report.Failed, report.Skipped, report.Errors))
+	}
+
+	for _, r := range report.Results {
+		lines = append(lines, "")
+		lines = append(lines, wrapPDFText(fmt.Sprintf("[%s] %s  %s (%s)", strings.ToUpper(string(r.Status)), r.Benchmark, r.Title, r.Severity), "")...)
+		if r.Evidence != "" {
+			lines = append(lines, wrapPDFText("Evidence: "+r.Evidence, "    ")...)
+		}
+		if r.Status == model.ComplianceFail && r.Remediation != "" {
+			lines = append(lines, wrapPDFText("Fix: "+r.Remediation, "    ")...)
+		}
+	}
+	return renderPDF(lines)
+}
+
+// wrapPDFText splits text into lines that fit the page, indenting the continuations
+func wrapPDFText(text, indent string) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for len(word) > pdfLineWidth-len(indent) {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			lines = append(lines, indent+word[:pdfLineWidth-len(indent)])
+			word = word[pdfLineWidth-len(indent):]
+		}
+		switch {
+		case line == "":
+			line = indent + word
+			if len(lines) == 0 {
+				line = word
+			}
+		case len(line)+1+len(word) > pdfLineWidth:
+			lines = append(lines, line)
+			line = indent + word
+		default:
+			line += " " + word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// renderPDF lays lines out on as many pages as they need. Only the built-in
+// Courier font is used, so characters outside ASCII are replaced.
+func renderPDF(lines []string) []byte {
+	var pages [][]string
+	for len(lines) > pdfLinesPerPage {
+		pages = append(pages, lines[:pdfLinesPerPage])
+		lines = lines[pdfLinesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	// Objects 1-3 are the catalog, page tree and font; each page is followed by its content
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>")
+	for i, page := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i))
+
+		var content strings.Builder
+		content.WriteString("BT /F1 9 Tf 11 TL 40 800 Td\n")
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) '\n", escapePDFText(line))
+		}
+		content.WriteString("ET")
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+func escapePDFText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,465 @@
+// Package service provides business logic for cluster cost attribution
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Cost grouping keys
+const (
+	CostGroupNamespace = "namespace"
+	costGroupLabel     = "label:"
+	// costUnallocated groups pods that lack the requested label
+	costUnallocated = "__unallocated__"
+)
+
+// costRollupInterval is how often daily cost rollups are refreshed
+const costRollupInterval = time.Hour
+
+const bytesPerGiB = 1024 * 1024 * 1024
+
+// CostService attributes cluster cost to namespaces and labels from collected pod metrics
+type CostService struct {
+	db             *gorm.DB
+	logger         *zap.Logger
+	defaults       model.ClusterPricing
+	sampleInterval time.Duration
+}
+
+// NewCostService creates a new cost service. defaults applies to clusters without their
+// own pricing and sampleInterval is the metrics collection interval.
+func NewCostService(db *gorm.DB, logger *zap.Logger, defaults model.ClusterPricing, sampleInterval time.Duration) *CostService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if defaults.Basis == "" {
+		defaults.Basis = model.CostBasisRequests
+	}
+	if sampleInterval <= 0 {
+		sampleInterval = time.Minute
+	}
+	return &CostService{
+		db:             db,
+		logger:         logger,
+		defaults:       defaults,
+		sampleInterval: sampleInterval,
+	}
+}
+
+// Pricing returns the pricing of a cluster, falling back to the configured defaults
+func (s *CostService) Pricing(clusterID uuid.UUID) (*model.ClusterPricing, error) {
+	var pricing model.ClusterPricing
+	err := s.db.Where("cluster_id = ?", clusterID).First(&pricing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		pricing = s.defaults
+		pricing.ClusterID = clusterID
+		return &pricing, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pricing: %w", err)
+	}
+	return &pricing, nil
+}
+
+// UpdatePricing validates and stores the pricing of a cluster
+func (s *CostService) UpdatePricing(clusterID uuid.UUID, req *model.UpdateClusterPricingRequest) (*model.ClusterPricing, error) {
+	if req.CPUHourly < 0 || req.MemoryGiBHourly < 0 {
+		return nil, fmt.Errorf("rates must not be negative")
+	}
+	if req.Currency == "" {
+		req.Currency = s.defaults.Currency
+	}
+	if len(req.Currency) != 3 {
+		return nil, fmt.Errorf("currency must be a 3-letter ISO 4217 code")
+	}
+	if req.Basis == "" {
+		req.Basis = model.CostBasisRequests
+	}
+	if !req.Basis.IsValid() {
+		return nil, fmt.Errorf("unsupported cost basis: %s", req.Basis)
+	}
+
+	var priceSheet string
+	if len(req.PriceSheet) > 0 {
+		for _, entry := range req.PriceSheet {
+			if entry.InstanceType == "" || entry.CPUHourly < 0 || entry.MemoryGiBHourly < 0 {
+				return nil, fmt.Errorf("price sheet entries need an instance type and non-negative rates")
+			}
+		}
+		data, err := json.Marshal(req.PriceSheet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode price sheet: %w", err)
+		}
+		priceSheet = string(data)
+	}
+
+	var pricing model.ClusterPricing
+	err := s.db.Where("cluster_id = ?", clusterID).First(&pricing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load pricing: %w", err)
+	}
+
+	pricing.ClusterID = clusterID
+	pricing.CPUHourly = req.CPUHourly
+	pricing.MemoryGiBHourly = req.MemoryGiBHourly
+	pricing.Currency = strings.ToUpper(req.Currency)
+	pricing.Basis = req.Basis
+	pricing.PriceSheet = priceSheet
+
+	if pricing.ID == uuid.Nil {
+		pricing.ID = uuid.New()
+		err = s.db.Create(&pricing).Error
+	} else {
+		err = s.db.Save(&pricing).Error
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save pricing: %w", err)
+	}
+	return &pricing, nil
+}
+
+// Costs attributes the cost of a cluster between start and end to groups of pods.
+// groupBy is "namespace" or "label:<key>"; an empty basis uses the cluster's pricing basis.
+// Only metrics within the collection retention can be attributed.
+func (s *CostService) Costs(ctx context.Context, cluster *model.K8sCluster, start, end time.Time, groupBy string, basis model.CostBasis) (*model.CostReport, error) {
+	if groupBy == "" {
+		groupBy = CostGroupNamespace
+	}
+	if groupBy != CostGroupNamespace && (!strings.HasPrefix(groupBy, costGroupLabel) || groupBy == costGroupLabel) {
+		return nil, fmt.Errorf("unsupported grouping: %s", groupBy)
+	}
+
+	pricing, err := s.Pricing(cluster.ID)
+	if err != nil {
+		return nil, err
+	}
+	if basis == "" {
+		basis = pricing.Basis
+	}
+	if !basis.IsValid() {
+		return nil, fmt.Errorf("unsupported cost basis: %s", basis)
+	}
+
+	var samples []model.PodMetric
+	if err := s.db.Where("cluster_id = ? AND timestamp >= ? AND timestamp < ?", cluster.ID, start.Unix(), end.Unix()).
+		Order("namespace, pod_name, timestamp").
+		Find(&samples).Error; err != nil {
+		return nil, fmt.Errorf("failed to load pod metrics: %w", err)
+	}
+
+	rates := s.nodeRates(ctx, cluster, pricing)
+	allocations := AllocateCosts(samples, pricing, rates, basis, groupBy, s.sampleInterval, end)
+
+	report := &model.CostReport{
+		ClusterID:   cluster.ID,
+		Start:       start,
+		End:         end,
+		GroupBy:     groupBy,
+		Basis:       basis,
+		Currency:    pricing.Currency,
+		Allocations: allocations,
+	}
+	for _, a := range allocations {
+		report.TotalCost += a.TotalCost
+	}
+	report.TotalCost = roundTo(report.TotalCost, 4)
+	return report, nil
+}
+
+// nodeRates maps node names to price sheet rates by instance type. Nodes are only
+// looked up when the cluster has a price sheet; failures fall back to the default rates.
+func (s *CostService) nodeRates(ctx context.Context, cluster *model.K8sCluster, pricing *model.ClusterPricing) map[string]model.PriceSheetEntry {
+	if pricing.PriceSheet == "" {
+		return nil
+	}
+
+	var sheet []model.PriceSheetEntry
+	if err := json.Unmarshal([]byte(pricing.PriceSheet), &sheet); err != nil {
+		s.logger.Warn("invalid price sheet", zap.String("cluster_id", cluster.ID.String()), zap.Error(err))
+		return nil
+	}
+	byType := make(map[string]model.PriceSheetEntry, len(sheet))
+	for _, entry := range sheet {
+		byType[entry.InstanceType] = entry
+	}
+
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		return nil
+	}
+	defer client.Close()
+
+	nodes, err := client.GetNodeCapacities(ctx)
+	if err != nil {
+		s.logger.Warn("failed to read node instance types", zap.String("cluster_id", cluster.ID.String()), zap.Error(err))
+		return nil
+	}
+
+	rates := make(map[string]model.PriceSheetEntry)
+	for _, node := range nodes {
+		if entry, ok := byType[node.InstanceType]; ok {
+			rates[node.NodeName] = entry
+		}
+	}
+	return rates
+}
+
+// AllocateCosts charges each pod metric sample for the time until the pod's next sample,
+// capped at two sample intervals so gaps in collection are not billed. Samples must be
+// ordered by namespace, pod and timestamp.
+func AllocateCosts(samples []model.PodMetric, pricing *model.ClusterPricing, nodeRates map[string]model.PriceSheetEntry, basis model.CostBasis, groupBy string, interval time.Duration, end time.Time) []model.CostAllocation {
+	labelKey := strings.TrimPrefix(groupBy, costGroupLabel)
+	maxGap := 2 * interval.Seconds()
+
+	groups := make(map[string]*model.CostAllocation)
+	pods := make(map[string]map[string]bool)
+
+	for i, sample := range samples {
+		seconds := interval.Seconds()
+		if i+1 < len(samples) && samples[i+1].Namespace == sample.Namespace && samples[i+1].PodName == sample.PodName {
+			seconds = math.Min(float64(samples[i+1].Timestamp-sample.Timestamp), maxGap)
+		} else if remaining := float64(end.Unix() - sample.Timestamp); remaining < seconds {
+			seconds = math.Max(remaining, 0)
+		}
+		hours := seconds / 3600
+
+		cpuCores, memoryBytes := chargedResources(sample, basis)
+		cpuRate, memoryRate := pricing.CPUHourly, pricing.MemoryGiBHourly
+		if entry, ok := nodeRates[sample.NodeName]; ok {
+			cpuRate, memoryRate = entry.CPUHourly, entry.MemoryGiBHourly
+		}
+
+		group := sample.Namespace
+		if groupBy != CostGroupNamespace {
+			group = sampleLabel(sample, labelKey)
+		}
+		a, ok := groups[group]
+		if !ok {
+			a = &model.CostAllocation{Group: group}
+			groups[group] = a
+			pods[group] = make(map[string]bool)
+		}
+		pods[group][sample.Namespace+"/"+sample.PodName] = true
+
+		coreHours := cpuCores * hours
+		gibHours := float64(memoryBytes) / bytesPerGiB * hours
+		a.CPUCoreHours += coreHours
+		a.MemoryGiBHours += gibHours
+		a.CPUCost += coreHours * cpuRate
+		a.MemoryCost += gibHours * memoryRate
+	}
+
+	result := make([]model.CostAllocation, 0, len(groups))
+	for group, a := range groups {
+		a.PodCount = len(pods[group])
+		a.TotalCost = roundTo(a.CPUCost+a.MemoryCost, 4)
+		a.CPUCost = roundTo(a.CPUCost, 4)
+		a.MemoryCost = roundTo(a.MemoryCost, 4)
+		a.CPUCoreHours = roundTo(a.CPUCoreHours, 4)
+		a.MemoryGiBHours = roundTo(a.MemoryGiBHours, 4)
+		result = append(result, *a)
+	}
+
+	// Most expensive first
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalCost != result[j].TotalCost {
+			return result[i].TotalCost > result[j].TotalCost
+		}
+		return result[i].Group < result[j].Group
+	})
+	return result
+}
+
+// chargedResources returns the CPU cores and memory bytes charged for a sample
+func chargedResources(sample model.PodMetric, basis model.CostBasis) (float64, int64) {
+	switch basis {
+	case model.CostBasisUsage:
+		return sample.CPUUsageCores, sample.MemoryUsageBytes
+	case model.CostBasisMax:
+		memory := sample.MemoryRequestBytes
+		if sample.MemoryUsageBytes > memory {
+			memory = sample.MemoryUsageBytes
+		}
+		return math.Max(sample.CPURequestCores, sample.CPUUsageCores), memory
+	default:
+		return sample.CPURequestCores, sample.MemoryRequestBytes
+	}
+}
+
+// sampleLabel returns the value of a label recorded with a sample
+func sampleLabel(sample model.PodMetric, key string) string {
+	if sample.Labels == "" {
+		return costUnallocated
+	}
+	var labels map[string]string
+	if err := json.Unmarshal([]byte(sample.Labels), &labels); err != nil {
+		return costUnallocated
+	}
+	if value, ok := labels[key]; ok && value != "" {
+		return value
+	}
+	return costUnallocated
+}
+
+// RollupDay stores the per-namespace cost of a cluster for the UTC day containing day,
+// replacing any earlier rollup of that day
+func (s *CostService) RollupDay(ctx context.Context, cluster *model.K8sCluster, day time.Time) error {
+	start := day.UTC().Truncate(24 * time.Hour)
+	end := start.Add(24 * time.Hour)
+
+	report, err := s.Costs(ctx, cluster, start, end, CostGroupNamespace, "")
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("cluster_id = ? AND day = ?", cluster.ID, start).
+			Delete(&model.ClusterCostDaily{}).Error; err != nil {
+			return fmt.Errorf("failed to clear cost rollup: %w", err)
+		}
+		for _, a := range report.Allocations {
+			row := &model.ClusterCostDaily{
+				ID:             uuid.New(),
+				ClusterID:      cluster.ID,
+				Day:            start,
+				Namespace:      a.Group,
+				CPUCoreHours:   a.CPUCoreHours,
+				MemoryGiBHours: a.MemoryGiBHours,
+				CPUCost:        a.CPUCost,
+				MemoryCost:     a.MemoryCost,
+				Currency:       report.Currency,
+			}
+			if err := tx.Create(row).Error; err != nil {
+				return fmt.Errorf("failed to store cost rollup: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Run refreshes the cost rollups of yesterday and today for every cluster until ctx is done
+func (s *CostService) Run(ctx context.Context) {
+	ticker := time.NewTicker(costRollupInterval)
+	defer ticker.Stop()
+
+	for {
+		s.rollupAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *CostService) rollupAll(ctx context.Context) {
+	var clusters []model.K8sCluster
+	if err := s.db.Find(&clusters).Error; err != nil {
+		s.logger.Error("failed to list clusters for cost rollup", zap.Error(err))
+		return
+	}
+
+	now := time.Now().UTC()
+	for i := range clusters {
+		for _, day := range []time.Time{now.Add(-24 * time.Hour), now} {
+			if err := s.RollupDay(ctx, &clusters[i], day); err != nil {
+				s.logger.Warn("cost rollup failed",
+					zap.String("cluster_id", clusters[i].ID.String()),
+					zap.Time("day", day),
+					zap.Error(err),
+				)
+			}
+		}
+	}
+}
+
+// Trend returns the monthly cost of a cluster for the last months calendar months
+func (s *CostService) Trend(clusterID uuid.UUID, months int) (*model.CostTrendReport, error) {
+	pricing, err := s.Pricing(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -(months - 1), 0)
+
+	var rows []model.ClusterCostDaily
+	if err := s.db.Where("cluster_id = ? AND day >= ?", clusterID, first).
+		Order("day ASC").
+		Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load cost rollups: %w", err)
+	}
+
+	return BuildCostTrend(clusterID, pricing.Currency, rows, first, months), nil
+}
+
+// BuildCostTrend sums daily rollups into calendar months starting at first
+func BuildCostTrend(clusterID uuid.UUID, currency string, rows []model.ClusterCostDaily, first time.Time, months int) *model.CostTrendReport {
+	report := &model.CostTrendReport{
+		ClusterID: clusterID,
+		Currency:  currency,
+		Months:    make([]model.CostTrendPoint, months),
+	}
+
+	index := make(map[string]int, months)
+	namespaces := make([]map[string]*model.CostAllocation, months)
+	for i := 0; i < months; i++ {
+		month := first.AddDate(0, i, 0).Format("2006-01")
+		report.Months[i] = model.CostTrendPoint{Month: month, Namespaces: []model.CostAllocation{}}
+		index[month] = i
+		namespaces[i] = make(map[string]*model.CostAllocation)
+	}
+
+	for _, row := range rows {
+		i, ok := index[row.Day.UTC().Format("2006-01")]
+		if !ok {
+			continue
+		}
+		point := &report.Months[i]
+		point.CPUCost += row.CPUCost
+		point.MemoryCost += row.MemoryCost
+
+		a, ok := namespaces[i][row.Namespace]
+		if !ok {
+			a = &model.CostAllocation{Group: row.Namespace}
+			namespaces[i][row.Namespace] = a
+		}
+		a.CPUCoreHours += row.CPUCoreHours
+		a.MemoryGiBHours += row.MemoryGiBHours
+		a.CPUCost += row.CPUCost
+		a.MemoryCost += row.MemoryCost
+	}
+
+	for i := range report.Months {
+		point := &report.Months[i]
+		point.CPUCost = roundTo(point.CPUCost, 2)
+		point.MemoryCost = roundTo(point.MemoryCost, 2)
+		point.TotalCost = roundTo(point.CPUCost+point.MemoryCost, 2)
+		for _, a := range namespaces[i] {
+			a.TotalCost = roundTo(a.CPUCost+a.MemoryCost, 2)
+			a.CPUCost = roundTo(a.CPUCost, 2)
+			a.MemoryCost = roundTo(a.MemoryCost, 2)
+			point.Namespaces = append(point.Namespaces, *a)
+		}
+		sort.Slice(point.Namespaces, func(x, y int) bool {
+			return point.Namespaces[x].TotalCost > point.Namespaces[y].TotalCost
+		})
+	}
+	return report
+}
@@ -0,0 +1,160 @@
+// Package service provides business logic for crontab management
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// ErrCrontabEntryNotFound is returned when an entry ID no longer matches any crontab line,
+// usually because the crontab changed since it was read
+var ErrCrontabEntryNotFound = errors.New("crontab entry not found")
+
+// envLinePattern matches crontab environment assignments such as MAILTO=root
+var envLinePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\s*=`)
+
+// ValidateCronSchedule checks a crontab schedule: five fields or an @ descriptor
+func ValidateCronSchedule(schedule string) error {
+	schedule = strings.TrimSpace(schedule)
+	if schedule == "" {
+		return fmt.Errorf("schedule is empty")
+	}
+	if schedule == "@reboot" {
+		return nil
+	}
+	// robfig/cron accepts extensions that crontab(5) does not
+	if strings.HasPrefix(schedule, "@every") || strings.HasPrefix(schedule, "CRON_TZ=") || strings.HasPrefix(schedule, "TZ=") {
+		return fmt.Errorf("unsupported schedule: %s", schedule)
+	}
+	if _, err := cron.ParseStandard(schedule); err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+	return nil
+}
+
+// NextCronExecutions returns the next n run times of a schedule after from.
+// @reboot schedules have no calendar times and return an empty list.
+func NextCronExecutions(schedule string, from time.Time, n int) ([]time.Time, error) {
+	if err := ValidateCronSchedule(schedule); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(schedule) == "@reboot" {
+		return []time.Time{}, nil
+	}
+
+	sched, err := cron.ParseStandard(strings.TrimSpace(schedule))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+
+	times := make([]time.Time, 0, n)
+	next := from
+	for i := 0; i < n; i++ {
+		next = sched.Next(next)
+		if next.IsZero() {
+			break
+		}
+		times = append(times, next)
+	}
+	return times, nil
+}
+
+// ParseCrontab extracts the job entries from crontab content. Commented-out lines
+// that still parse as jobs are returned as disabled entries.
+func ParseCrontab(content string) []model.CrontabEntry {
+	entries := []model.CrontabEntry{}
+	for i, line := range strings.Split(content, "\n") {
+		if entry, ok := parseCrontabLine(line); ok {
+			entry.Line = i + 1
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// FormatCrontabEntry renders an entry as a crontab line
+func FormatCrontabEntry(schedule, command string, disabled bool) string {
+	line := strings.TrimSpace(schedule) + " " + strings.TrimSpace(command)
+	if disabled {
+		line = "#" + line
+	}
+	return line
+}
+
+// AddCrontabEntry appends a line to crontab content
+func AddCrontabEntry(content, line string) string {
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return content + line + "\n"
+}
+
+// ReplaceCrontabEntry replaces the line of the entry with the given ID.
+// An empty replacement removes the line.
+func ReplaceCrontabEntry(content, entryID, replacement string) (string, error) {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		entry, ok := parseCrontabLine(line)
+		if !ok || entry.ID != entryID {
+			continue
+		}
+		if replacement == "" {
+			lines = append(lines[:i], lines[i+1:]...)
+		} else {
+			lines[i] = replacement
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	return "", ErrCrontabEntryNotFound
+}
+
+// parseCrontabLine parses one crontab line into an entry
+func parseCrontabLine(line string) (model.CrontabEntry, bool) {
+	text := strings.TrimSpace(line)
+	disabled := false
+	if strings.HasPrefix(text, "#") {
+		disabled = true
+		text = strings.TrimSpace(strings.TrimPrefix(text, "#"))
+	}
+	if text == "" || envLinePattern.MatchString(text) {
+		return model.CrontabEntry{}, false
+	}
+
+	fields := strings.Fields(text)
+	var schedule string
+	var command string
+	if strings.HasPrefix(fields[0], "@") {
+		if len(fields) < 2 {
+			return model.CrontabEntry{}, false
+		}
+		schedule = fields[0]
+		command = strings.Join(fields[1:], " ")
+	} else {
+		if len(fields) < 6 {
+			return model.CrontabEntry{}, false
+		}
+		schedule = strings.Join(fields[:5], " ")
+		command = strings.Join(fields[5:], " ")
+	}
+
+	if ValidateCronSchedule(schedule) != nil {
+		// Plain comments and malformed lines are not entries
+		return model.CrontabEntry{}, false
+	}
+
+	sum := sha256.Sum256([]byte(strings.TrimSpace(line)))
+	return model.CrontabEntry{
+		ID:       hex.EncodeToString(sum[:6]),
+		Schedule: schedule,
+		Command:  command,
+		Disabled: disabled,
+	}, true
+}
@@ -0,0 +1,339 @@
+// Package service provides server-side rendering of Prometheus dashboards
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// Dashboard rendering limits
+const (
+	defaultDashboardRange      = time.Hour
+	maxDashboardRange          = 31 * 24 * time.Hour
+	minDashboardStep           = 15 * time.Second
+	targetDashboardPoints      = 300
+	maxDashboardPoints         = 11000 // Prometheus rejects range queries above 11,000 points
+	dashboardRenderConcurrency = 8     // Queries run against the data sources at once
+	dashboardRenderTimeout     = 30 * time.Second
+)
+
+var (
+	// ErrInvalidDashboardRender is returned when a render request or dashboard config is malformed
+	ErrInvalidDashboardRender = errors.New("invalid dashboard render request")
+	// ErrDashboardNotFound is returned when the dashboard does not exist or is not visible to the caller
+	ErrDashboardNotFound = errors.New("dashboard not found")
+	// ErrDashboardPanelNotFound is returned when the requested panel is not on the dashboard
+	ErrDashboardPanelNotFound = errors.New("dashboard panel not found")
+)
+
+// legendPlaceholder matches {{label}} in a legend format
+var legendPlaceholder = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+
+// variableReference matches $name, ${name}, ${name:format} and [[name]] in a query
+var variableReference = regexp.MustCompile(`\$\{(\w+)(?::\w+)?\}|\[\[(\w+)\]\]|\$(\w+)`)
+
+// DashboardRenderService evaluates the panel queries of Prometheus dashboards.
+// Queries run with the data sources of the dashboard's owner, so a public
+// dashboard can be viewed without its data source credentials reaching the browser.
+type DashboardRenderService struct {
+	db *gorm.DB
+}
+
+// NewDashboardRenderService creates a new dashboard render service
+func NewDashboardRenderService(db *gorm.DB) *DashboardRenderService {
+	return &DashboardRenderService{db: db}
+}
+
+// panelSource is the data source a panel's queries run against
+type panelSource struct {
+	ds     *model.PrometheusDataSource
+	client PrometheusQuerier
+	err    error
+}
+
+// Render runs the queries of every panel of a dashboard the user owns or that is
+// public, or of only req.PanelID, in parallel, with a copy of each repeated panel
+// per value of its variable, and the annotations over the range. Failed queries
+// are reported per panel.
+func (s *DashboardRenderService) Render(ctx context.Context, userID, dashboardID uuid.UUID, req *model.DashboardRenderRequest) (*model.DashboardRenderResult, error) {
+	step, err := normalizeDashboardRender(req)
+	if err != nil {
+		return nil, err
+	}
+
+	dashboard, config, err := s.dashboard(userID, dashboardID)
+	if err != nil {
+		return nil, err
+	}
+
+	panels := config.Panels
+	if req.PanelID != "" {
+		panels = nil
+		for _, panel := range config.Panels {
+			if string(panel.ID) == req.PanelID {
+				panels = append(panels, panel)
+				break
+			}
+		}
+		if panels == nil {
+			return nil, ErrDashboardPanelNotFound
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dashboardRenderTimeout)
+	defer cancel()
+
+	sources := make(map[uuid.UUID]*panelSource)
+	defaultSource := s.panelSource(dashboard, config, &model.PrometheusDashboardPanel{}, sources)
+	resolved := resolveVariables(ctx, defaultSource, config, req.Variables, builtinVariables(req, step), req.Start, req.End, false)
+	repeats := repeatPanels(panels, resolved)
+
+	points := int(req.End.Sub(req.Start)/step) + 1
+	result := &model.DashboardRenderResult{
+		DashboardID: dashboard.ID,
+		Start:       req.Start,
+		End:         req.End,
+		Step:        step.String(),
+		Timestamps:  make([]time.Time, points),
+		Panels:      make([]model.DashboardPanelResult, len(repeats)),
+	}
+	for i := range result.Timestamps {
+		result.Timestamps[i] = req.Start.Add(time.Duration(i) * step)
+	}
+
+	series := make([][][]model.DashboardPanelSeries, len(repeats))
+	failures := make([][]string, len(repeats))
+	warnings := make([][][]string, len(repeats))
+	slots := make(chan struct{}, dashboardRenderConcurrency)
+	var wg sync.WaitGroup
+	for i, rp := range repeats {
+		panel := rp.panel
+		out := &result.Panels[i]
+		*out = model.DashboardPanelResult{
+			ID:          string(panel.ID),
+			Title:       panel.Title,
+			Type:        panel.Type,
+			GridPos:     panel.GridPos,
+			Repeat:      panel.Repeat,
+			RepeatValue: rp.repeatValue,
+			Series:      []model.DashboardPanelSeries{},
+		}
+		if rp.warning != "" {
+			out.Warnings = []string{rp.warning}
+		}
+
+		source := s.panelSource(dashboard, config, &panel, sources)
+		if source.err != nil {
+			out.Error = source.err.Error()
+			continue
+		}
+		out.DataSourceID = &source.ds.ID
+
+		series[i] = make([][]model.DashboardPanelSeries, len(panel.Targets))
+		failures[i] = make([]string, len(panel.Targets))
+		warnings[i] = make([][]string, len(panel.Targets))
+		for j, target := range panel.Targets {
+			if target.Hide {
+				continue
+			}
+			if strings.TrimSpace(target.Expr) == "" && target.Builder != nil {
+				built, err := BuildPromQL(target.Builder)
+				if err != nil {
+					failures[i][j] = fmt.Sprintf("%s: %v", targetName(target, j), err)
+					continue
+				}
+				target.Expr = built
+			}
+			if strings.TrimSpace(target.Expr) == "" {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+
+				found, warned, err := source.client.QueryRange(ctx, expandVariables(target.Expr, rp.values), req.Start, req.End, step)
+				warnings[i][j] = warned
+				if err != nil {
+					failures[i][j] = fmt.Sprintf("%s: %v", targetName(target, j), err)
+					return
+				}
+				for _, ps := range found {
+					series[i][j] = append(series[i][j], alignSeries(target, ps, req.Start, step, points))
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for i := range result.Panels {
+		var errs []string
+		for j := range series[i] {
+			result.Panels[i].Series = append(result.Panels[i].Series, series[i][j]...)
+			if failures[i][j] != "" {
+				errs = append(errs, failures[i][j])
+			}
+			result.Panels[i].Warnings = append(result.Panels[i].Warnings, warnings[i][j]...)
+		}
+		if len(errs) > 0 {
+			result.Panels[i].Error = strings.Join(errs, "; ")
+		}
+	}
+
+	if result.Annotations, err = dashboardAnnotations(s.db, dashboard, config.AnnotationFilter, req.Start, req.End); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// normalizeDashboardRender validates the time range, fills in defaults and returns
+// the step. The start is aligned to the step so every panel shares one grid.
+func normalizeDashboardRender(req *model.DashboardRenderRequest) (time.Duration, error) {
+	if req.End.IsZero() {
+		req.End = time.Now()
+	}
+	if req.Start.IsZero() {
+		req.Start = req.End.Add(-defaultDashboardRange)
+	}
+	if !req.Start.Before(req.End) {
+		return 0, fmt.Errorf("%w: start must be before end", ErrInvalidDashboardRender)
+	}
+	if req.End.Sub(req.Start) > maxDashboardRange {
+		return 0, fmt.Errorf("%w: time range must not exceed %s", ErrInvalidDashboardRender, maxDashboardRange)
+	}
+
+	var step time.Duration
+	if req.Step != "" {
+		d, err := time.ParseDuration(req.Step)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("%w: invalid step", ErrInvalidDashboardRender)
+		}
+		step = max(d.Truncate(time.Second), time.Second)
+	} else {
+		step = max((req.End.Sub(req.Start) / targetDashboardPoints).Truncate(time.Second), minDashboardStep)
+	}
+	if int(req.End.Sub(req.Start)/step) > maxDashboardPoints {
+		return 0, fmt.Errorf("%w: step is too small for the time range", ErrInvalidDashboardRender)
+	}
+
+	req.Start = req.Start.UTC().Truncate(step)
+	req.End = req.End.UTC()
+	return step, nil
+}
+
+// expandVariables replaces the variable references in a query. Unknown
+// variables are left for Prometheus to reject.
+func expandVariables(expr string, values map[string]string) string {
+	return variableReference.ReplaceAllStringFunc(expr, func(ref string) string {
+		m := variableReference.FindStringSubmatch(ref)
+		name := m[1] + m[2] + m[3]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// panelSource returns the data source of a panel: the one it names, else the
+// dashboard's default, else the owner's active data source for the dashboard's
+// cluster or their oldest active one. Lookups are shared between panels.
+func (s *DashboardRenderService) panelSource(dashboard *model.PrometheusDashboard, config *model.PrometheusDashboardConfig, panel *model.PrometheusDashboardPanel, sources map[uuid.UUID]*panelSource) *panelSource {
+	id := panel.DataSourceID
+	if id == nil {
+		id = config.DataSourceID
+	}
+	key := uuid.Nil
+	if id != nil {
+		key = *id
+	}
+	if source, ok := sources[key]; ok {
+		return source
+	}
+
+	source := &panelSource{}
+	sources[key] = source
+	query := s.db.Where("user_id = ? AND status = ?", dashboard.UserID, model.DSStatusActive)
+	if id != nil {
+		query = query.Where("id = ?", *id)
+	} else if dashboard.ClusterID != nil {
+		query = query.Order(gorm.Expr("COALESCE(cluster_id = ?, false) DESC", *dashboard.ClusterID))
+	}
+	var ds model.PrometheusDataSource
+	if err := query.Order("created_at").First(&ds).Error; err != nil {
+		source.err = errors.New(dataSourceError("prometheus", err))
+		return source
+	}
+	source.ds = &ds
+	source.client, source.err = NewDataSourceQuerier(s.db, &ds)
+	return source
+}
+
+// alignSeries places the samples of a series on the render grid, dropping those
+// JSON cannot represent
+func alignSeries(target model.PrometheusDashboardTarget, ps model.PrometheusSeries, start time.Time, step time.Duration, points int) model.DashboardPanelSeries {
+	labels := make(map[string]string, len(ps.Metric))
+	for k, v := range ps.Metric {
+		if k != "__name__" {
+			labels[k] = v
+		}
+	}
+
+	values := make([]*float64, points)
+	origin := float64(start.UnixNano()) / 1e9
+	for _, sample := range ps.Values {
+		value, err := strconv.ParseFloat(sample.Value, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		if i := int(math.Round((sample.Timestamp - origin) / step.Seconds())); i >= 0 && i < points {
+			values[i] = &value
+		}
+	}
+	return model.DashboardPanelSeries{RefID: target.RefID, Name: seriesName(target, ps.Metric), Labels: labels, Values: values}
+}
+
+// seriesName renders the target's legend format, or the series selector without one
+func seriesName(target model.PrometheusDashboardTarget, metric map[string]string) string {
+	if target.LegendFormat != "" {
+		return legendPlaceholder.ReplaceAllStringFunc(target.LegendFormat, func(m string) string {
+			return metric[legendPlaceholder.FindStringSubmatch(m)[1]]
+		})
+	}
+
+	keys := make([]string, 0, len(metric))
+	for k := range metric {
+		if k != "__name__" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + strconv.Quote(metric[k])
+	}
+	if len(pairs) == 0 && metric["__name__"] == "" {
+		return target.Expr
+	}
+	return metric["__name__"] + "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// targetName identifies a target in error messages
+func targetName(target model.PrometheusDashboardTarget, index int) string {
+	if target.RefID != "" {
+		return target.RefID
+	}
+	return fmt.Sprintf("query %d", index+1)
+}
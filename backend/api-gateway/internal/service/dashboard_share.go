@@ -0,0 +1,276 @@
+// Package service provides public share links to Prometheus dashboards
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+// Share link defaults
+const (
+	defaultShareLinkRange = time.Hour
+	shareLinkBurst        = 5
+	maxShareLinkAccesses  = 500
+)
+
+var (
+	// ErrInvalidShareLink is returned when a share link cannot be created as requested
+	ErrInvalidShareLink = errors.New("invalid share link")
+	// ErrShareLinkNotFound is returned for unknown tokens and links
+	ErrShareLinkNotFound = errors.New("share link not found")
+	// ErrShareLinkExpired is returned for expired and revoked links
+	ErrShareLinkExpired = errors.New("share link has expired")
+	// ErrShareLinkRateLimited is returned when a link is opened too often
+	ErrShareLinkRateLimited = errors.New("share link rate limit exceeded")
+)
+
+// DashboardShareService manages public links to dashboards and serves them
+type DashboardShareService struct {
+	db       *gorm.DB
+	settings *SettingsService
+	renderer *DashboardRenderService
+
+	mu       sync.Mutex
+	limiters map[uuid.UUID]*rate.Limiter
+}
+
+// NewDashboardShareService creates a new dashboard share service
+func NewDashboardShareService(db *gorm.DB, settings *SettingsService, renderer *DashboardRenderService) *DashboardShareService {
+	return &DashboardShareService{
+		db:       db,
+		settings: settings,
+		renderer: renderer,
+		limiters: make(map[uuid.UUID]*rate.Limiter),
+	}
+}
+
+// Create shares a dashboard the user owns. A frozen link renders the dashboard now
+// and keeps the result.
+func (s *DashboardShareService) Create(ctx context.Context, userID, dashboardID uuid.UUID, req *model.CreateDashboardShareLinkRequest) (*model.DashboardShareLinkResult, error) {
+	dashboard, err := s.ownedDashboard(userID, dashboardID)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := s.settings.Duration(model.SettingDashboardShareLinkTTL)
+	if req.ExpiresIn != "" {
+		if ttl, err = time.ParseDuration(req.ExpiresIn); err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("%w: invalid expiresIn", ErrInvalidShareLink)
+		}
+	}
+	if maxTTL := s.settings.Duration(model.SettingDashboardShareLinkMaxTTL); ttl > maxTTL {
+		return nil, fmt.Errorf("%w: links may last at most %s", ErrInvalidShareLink, maxTTL)
+	}
+	span := defaultShareLinkRange
+	if req.Range != "" {
+		if span, err = time.ParseDuration(req.Range); err != nil || span <= 0 {
+			return nil, fmt.Errorf("%w: invalid range", ErrInvalidShareLink)
+		}
+	}
+
+	now := time.Now()
+	render := &model.DashboardRenderRequest{Start: now.Add(-span), End: now, Step: req.Step}
+	link := &model.DashboardShareLink{
+		DashboardID: dashboard.ID,
+		CreatedBy:   userID,
+		Name:        strings.TrimSpace(req.Name),
+		Range:       int64(span / time.Second),
+		Step:        req.Step,
+		Frozen:      req.Frozen,
+		ExpiresAt:   now.Add(ttl),
+	}
+	if req.Frozen {
+		data, err := s.renderer.Render(ctx, dashboard.UserID, dashboard.ID, render)
+		if err != nil {
+			return nil, shareRenderError(err)
+		}
+		snapshot, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		link.Snapshot, link.SnapshotAt = string(snapshot), &now
+	} else if _, err := normalizeDashboardRender(render); err != nil {
+		return nil, shareRenderError(err)
+	}
+
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	link.TokenHash = tokenHash
+	if err := s.db.Create(link).Error; err != nil {
+		return nil, err
+	}
+	link.Status = link.StatusAt(now)
+
+	base := strings.TrimRight(s.settings.String(model.SettingAuthFrontendURL), "/")
+	return &model.DashboardShareLinkResult{Link: link, Token: token, URL: base + "/public/dashboards/" + token}, nil
+}
+
+// List returns the share links of a dashboard the user owns, newest first
+func (s *DashboardShareService) List(userID, dashboardID uuid.UUID) ([]model.DashboardShareLink, error) {
+	if _, err := s.ownedDashboard(userID, dashboardID); err != nil {
+		return nil, err
+	}
+	var links []model.DashboardShareLink
+	if err := s.db.Where("dashboard_id = ?", dashboardID).Order("created_at DESC").Find(&links).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range links {
+		links[i].Status = links[i].StatusAt(now)
+	}
+	return links, nil
+}
+
+// Revoke stops a share link from working. Revoking a revoked link is a no-op.
+func (s *DashboardShareService) Revoke(userID, dashboardID, linkID uuid.UUID) error {
+	if _, err := s.ownedDashboard(userID, dashboardID); err != nil {
+		return err
+	}
+	result := s.db.Model(&model.DashboardShareLink{}).
+		Where("id = ? AND dashboard_id = ?", linkID, dashboardID).
+		Update("revoked_at", gorm.Expr("COALESCE(revoked_at, ?)", time.Now()))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrShareLinkNotFound
+	}
+	s.mu.Lock()
+	delete(s.limiters, linkID)
+	s.mu.Unlock()
+	return nil
+}
+
+// Accesses returns the most recent attempts to open a share link of a dashboard
+// the user owns
+func (s *DashboardShareService) Accesses(userID, dashboardID, linkID uuid.UUID) ([]model.DashboardShareLinkAccess, error) {
+	if _, err := s.ownedDashboard(userID, dashboardID); err != nil {
+		return nil, err
+	}
+	if err := s.db.Select("id").Where("id = ? AND dashboard_id = ?", linkID, dashboardID).First(&model.DashboardShareLink{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareLinkNotFound
+		}
+		return nil, err
+	}
+	var accesses []model.DashboardShareLinkAccess
+	err := s.db.Where("link_id = ?", linkID).Order("created_at DESC").Limit(maxShareLinkAccesses).Find(&accesses).Error
+	return accesses, err
+}
+
+// View returns the dashboard behind a token. Live links are rendered with the
+// owner's data sources. Every attempt on a known link is recorded.
+func (s *DashboardShareService) View(ctx context.Context, token, ipAddress, userAgent string) (*model.SharedDashboard, error) {
+	var link model.DashboardShareLink
+	if err := s.db.Where("token_hash = ?", hashSecretToken(token)).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareLinkNotFound
+		}
+		return nil, err
+	}
+
+	shared, outcome, err := s.view(ctx, &link)
+	s.db.Create(&model.DashboardShareLinkAccess{LinkID: link.ID, Outcome: outcome, IPAddress: ipAddress, UserAgent: userAgent})
+	if outcome == model.ShareLinkAccessServed {
+		s.db.Model(&link).Updates(map[string]interface{}{
+			"access_count":     gorm.Expr("access_count + 1"),
+			"last_accessed_at": time.Now(),
+		})
+	}
+	return shared, err
+}
+
+// view serves a link and returns the outcome to record
+func (s *DashboardShareService) view(ctx context.Context, link *model.DashboardShareLink) (*model.SharedDashboard, string, error) {
+	switch link.StatusAt(time.Now()) {
+	case model.ShareLinkStatusRevoked:
+		return nil, model.ShareLinkAccessRevoked, ErrShareLinkExpired
+	case model.ShareLinkStatusExpired:
+		return nil, model.ShareLinkAccessExpired, ErrShareLinkExpired
+	}
+	if !s.limiter(link.ID).Allow() {
+		return nil, model.ShareLinkAccessRateLimited, ErrShareLinkRateLimited
+	}
+
+	var dashboard model.PrometheusDashboard
+	if err := s.db.First(&dashboard, "id = ?", link.DashboardID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, model.ShareLinkAccessFailed, ErrShareLinkNotFound
+		}
+		return nil, model.ShareLinkAccessFailed, err
+	}
+	shared := &model.SharedDashboard{
+		Name:        dashboard.Name,
+		Description: dashboard.Description,
+		Config:      dashboard.Config,
+		Frozen:      link.Frozen,
+		ExpiresAt:   link.ExpiresAt,
+	}
+
+	if link.Frozen {
+		if err := json.Unmarshal([]byte(link.Snapshot), &shared.Data); err != nil {
+			return nil, model.ShareLinkAccessFailed, fmt.Errorf("invalid snapshot: %w", err)
+		}
+		return shared, model.ShareLinkAccessServed, nil
+	}
+	now := time.Now()
+	data, err := s.renderer.Render(ctx, dashboard.UserID, dashboard.ID, &model.DashboardRenderRequest{
+		Start: now.Add(-time.Duration(link.Range) * time.Second),
+		End:   now,
+		Step:  link.Step,
+	})
+	if err != nil {
+		return nil, model.ShareLinkAccessFailed, err
+	}
+	shared.Data = data
+	shared.RefreshRate = dashboard.RefreshRate
+	return shared, model.ShareLinkAccessServed, nil
+}
+
+// limiter returns the rate limiter of a link, following the rate setting
+func (s *DashboardShareService) limiter(linkID uuid.UUID) *rate.Limiter {
+	limit := rate.Every(time.Minute / time.Duration(max(s.settings.Int(model.SettingDashboardShareLinkPerMinute), 1)))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	limiter, ok := s.limiters[linkID]
+	if !ok {
+		limiter = rate.NewLimiter(limit, shareLinkBurst)
+		s.limiters[linkID] = limiter
+	} else if limiter.Limit() != limit {
+		limiter.SetLimit(limit)
+	}
+	return limiter
+}
+
+// ownedDashboard returns a dashboard of the user
+func (s *DashboardShareService) ownedDashboard(userID, dashboardID uuid.UUID) (*model.PrometheusDashboard, error) {
+	var dashboard model.PrometheusDashboard
+	if err := s.db.Where("id = ? AND user_id = ?", dashboardID, userID).First(&dashboard).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDashboardNotFound
+		}
+		return nil, err
+	}
+	return &dashboard, nil
+}
+
+// shareRenderError reports an invalid time range as an invalid link
+func shareRenderError(err error) error {
+	if errors.Is(err, ErrInvalidDashboardRender) {
+		return fmt.Errorf("%w: %v", ErrInvalidShareLink, strings.TrimPrefix(err.Error(), ErrInvalidDashboardRender.Error()+": "))
+	}
+	return err
+}
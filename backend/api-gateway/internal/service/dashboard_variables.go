@@ -0,0 +1,473 @@
+// Package service provides the template variables and repeated panels of
+// Prometheus dashboards
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// maxDashboardRepeats is the most copies of a repeated panel that are rendered
+const maxDashboardRepeats = 50
+
+// ErrInvalidDashboardConfig is returned when a dashboard config fails validation on save
+var ErrInvalidDashboardConfig = errors.New("invalid dashboard config")
+
+var (
+	// variableName is the name of a template variable; it cannot start with __,
+	// which the built-in variables use
+	variableName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	labelValuesQuery = regexp.MustCompile(`^label_values\(\s*(?:(.+)\s*,\s*)?([a-zA-Z_][a-zA-Z0-9_]*)\s*\)$`)
+	labelNamesQuery  = regexp.MustCompile(`^label_names\(\s*(.*?)\s*\)$`)
+	metricsQuery     = regexp.MustCompile(`^metrics\(\s*(.*?)\s*\)$`)
+	queryResultQuery = regexp.MustCompile(`^query_result\(\s*(.+?)\s*\)$`)
+)
+
+// variableQuery is the parsed query of a query variable
+type variableQuery struct {
+	kind     string // label_values, label_names, metrics or query_result
+	selector string // Series selector of label_values and label_names, or the expression of query_result
+	label    string // Label of label_values
+	pattern  string // Metric name regex of metrics
+}
+
+// parseVariableQuery parses the query of a query variable
+func parseVariableQuery(query string) (*variableQuery, error) {
+	query = strings.TrimSpace(query)
+	if m := labelValuesQuery.FindStringSubmatch(query); m != nil {
+		return &variableQuery{kind: "label_values", selector: strings.TrimSpace(m[1]), label: m[2]}, nil
+	}
+	if m := labelNamesQuery.FindStringSubmatch(query); m != nil {
+		return &variableQuery{kind: "label_names", selector: m[1]}, nil
+	}
+	if m := metricsQuery.FindStringSubmatch(query); m != nil {
+		return &variableQuery{kind: "metrics", pattern: m[1]}, nil
+	}
+	if m := queryResultQuery.FindStringSubmatch(query); m != nil {
+		return &variableQuery{kind: "query_result", selector: m[1]}, nil
+	}
+	return nil, fmt.Errorf("query must be label_values(label), label_values(selector, label), label_names(), metrics(regex) or query_result(expr)")
+}
+
+// options evaluates the query over the time range
+func (q *variableQuery) options(ctx context.Context, client PrometheusQuerier, start, end time.Time) ([]string, error) {
+	var matchers []string
+	if q.selector != "" {
+		matchers = []string{q.selector}
+	}
+	switch q.kind {
+	case "label_values":
+		values, _, err := client.LabelValues(ctx, q.label, matchers, start, end)
+		return values, err
+	case "label_names":
+		names, _, err := client.LabelNames(ctx, matchers, start, end)
+		return names, err
+	case "metrics":
+		pattern, err := regexp.Compile(q.pattern)
+		if err != nil {
+			return nil, err
+		}
+		names, _, err := client.LabelValues(ctx, "__name__", nil, start, end)
+		if err != nil {
+			return nil, err
+		}
+		var options []string
+		for _, name := range names {
+			if pattern.MatchString(name) {
+				options = append(options, name)
+			}
+		}
+		return options, nil
+	}
+
+	series, _, err := client.Query(ctx, q.selector, end)
+	if err != nil {
+		return nil, err
+	}
+	options := make([]string, 0, len(series))
+	for _, s := range series {
+		option := seriesName(model.PrometheusDashboardTarget{}, s.Metric)
+		if s.Value != nil {
+			option += fmt.Sprintf(" %s %d", s.Value.Value, int64(s.Value.Timestamp*1000))
+		}
+		options = append(options, strings.TrimSpace(option))
+	}
+	return options, nil
+}
+
+// variableRegex compiles the regex filter of a variable, given bare or as /regex/
+func variableRegex(v *model.PrometheusDashboardVariable) (*regexp.Regexp, error) {
+	if v.Regex == "" {
+		return nil, nil
+	}
+	pattern := v.Regex
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		pattern = pattern[1 : len(pattern)-1]
+	}
+	return regexp.Compile(pattern)
+}
+
+// filterOptions keeps the options the regex matches, or the first group of the
+// match when it has one, without repeats
+func filterOptions(options []string, re *regexp.Regexp) []string {
+	seen := make(map[string]bool, len(options))
+	filtered := []string{}
+	for _, option := range options {
+		if re != nil {
+			m := re.FindStringSubmatch(option)
+			if m == nil {
+				continue
+			}
+			if len(m) > 1 && m[1] != "" {
+				option = m[1]
+			}
+		}
+		if !seen[option] {
+			seen[option] = true
+			filtered = append(filtered, option)
+		}
+	}
+	return filtered
+}
+
+// resolvedVariables are the variables of a dashboard with their selections
+type resolvedVariables struct {
+	results []model.DashboardVariableResult
+	values  map[string]string // What queries are expanded with
+}
+
+// selected returns the values selected for a variable: each of its options for
+// All, else the values of its alternation
+func (r *resolvedVariables) selected(name string) []string {
+	for _, v := range r.results {
+		if v.Name != name {
+			continue
+		}
+		if v.Current == model.DashboardVariableAll {
+			return v.Options
+		}
+		if v.Current == "" {
+			return nil
+		}
+		return strings.Split(v.Current, "|")
+	}
+	return nil
+}
+
+// resolveVariables resolves the dashboard's variables in order, each query
+// expanded with the variables before it, starting from the built-in values. The
+// options of query variables are only fetched when every option is wanted, the
+// variable has no selection, or a panel repeats for All of it. Variables whose
+// options cannot be fetched keep their saved options and report why.
+func resolveVariables(ctx context.Context, source *panelSource, config *model.PrometheusDashboardConfig, overrides map[string]string, builtins map[string]string, start, end time.Time, every bool) *resolvedVariables {
+	repeated := make(map[string]bool)
+	for _, panel := range config.Panels {
+		if panel.Repeat != "" {
+			repeated[panel.Repeat] = true
+		}
+	}
+
+	resolved := &resolvedVariables{values: make(map[string]string, len(builtins)+len(config.Variables))}
+	for name, value := range builtins {
+		resolved.values[name] = value
+	}
+	for i := range config.Variables {
+		v := &config.Variables[i]
+		result := model.DashboardVariableResult{
+			Name:       v.Name,
+			Label:      v.Label,
+			Type:       v.Type,
+			Current:    v.Current,
+			Options:    v.Options,
+			Multi:      v.Multi,
+			IncludeAll: v.IncludeAll,
+		}
+		if value, ok := overrides[v.Name]; ok {
+			result.Current = value
+		}
+
+		switch v.Type {
+		case model.DashboardVariableQuery:
+			if every || result.Current == "" || (result.Current == model.DashboardVariableAll && repeated[v.Name]) {
+				options, err := variableOptions(ctx, source, v, resolved.values, start, end)
+				if err != nil {
+					result.Error = err.Error()
+				} else {
+					result.Options = options
+				}
+			}
+		case model.DashboardVariableCustom:
+			if len(result.Options) == 0 {
+				for _, option := range strings.Split(v.Query, ",") {
+					if option = strings.TrimSpace(option); option != "" {
+						result.Options = append(result.Options, option)
+					}
+				}
+			}
+		case model.DashboardVariableConstant, model.DashboardVariableTextbox:
+			if result.Current == "" {
+				result.Current = v.Query
+			}
+		}
+		if result.Current == "" {
+			if v.IncludeAll {
+				result.Current = model.DashboardVariableAll
+			} else if len(result.Options) > 0 {
+				result.Current = result.Options[0]
+			}
+		}
+		if result.Options == nil {
+			result.Options = []string{}
+		}
+
+		value := result.Current
+		switch {
+		case value == model.DashboardVariableAll:
+			value = v.AllValue
+			if value == "" {
+				value = ".*"
+			}
+		case v.Type == model.DashboardVariableInterval && (value == "" || value == "auto"):
+			value = resolved.values["__interval"]
+		}
+		resolved.values[v.Name] = value
+		resolved.results = append(resolved.results, result)
+	}
+	for name, value := range overrides {
+		if _, ok := resolved.values[name]; !ok {
+			resolved.values[name] = value
+		}
+	}
+	return resolved
+}
+
+// variableOptions fetches the options of a query variable from the dashboard's
+// data source and filters them with its regex
+func variableOptions(ctx context.Context, source *panelSource, v *model.PrometheusDashboardVariable, values map[string]string, start, end time.Time) ([]string, error) {
+	if source.err != nil {
+		return nil, source.err
+	}
+	query, err := parseVariableQuery(expandVariables(v.Query, values))
+	if err != nil {
+		return nil, err
+	}
+	re, err := variableRegex(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+	options, err := query.options(ctx, source.client, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return filterOptions(options, re), nil
+}
+
+// Variables resolves the options and selections of the template variables of a
+// dashboard the user owns or that is public, over the time range of req and with
+// its overrides
+func (s *DashboardRenderService) Variables(ctx context.Context, userID, dashboardID uuid.UUID, req *model.DashboardRenderRequest) ([]model.DashboardVariableResult, error) {
+	step, err := normalizeDashboardRender(req)
+	if err != nil {
+		return nil, err
+	}
+	dashboard, config, err := s.dashboard(userID, dashboardID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dashboardRenderTimeout)
+	defer cancel()
+	source := s.panelSource(dashboard, config, &model.PrometheusDashboardPanel{}, make(map[uuid.UUID]*panelSource))
+	resolved := resolveVariables(ctx, source, config, req.Variables, builtinVariables(req, step), req.Start, req.End, true)
+	return resolved.results, nil
+}
+
+// dashboard loads a dashboard the user owns or that is public and its config
+func (s *DashboardRenderService) dashboard(userID, dashboardID uuid.UUID) (*model.PrometheusDashboard, *model.PrometheusDashboardConfig, error) {
+	var dashboard model.PrometheusDashboard
+	if err := s.db.Where("id = ? AND (user_id = ? OR is_public = ?)", dashboardID, userID, true).First(&dashboard).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrDashboardNotFound
+		}
+		return nil, nil, err
+	}
+	var config model.PrometheusDashboardConfig
+	if err := json.Unmarshal([]byte(dashboard.Config), &config); err != nil {
+		return nil, nil, fmt.Errorf("%w: dashboard config is not valid JSON: %v", ErrInvalidDashboardRender, err)
+	}
+	return &dashboard, &config, nil
+}
+
+// repeatedPanel is one copy of a panel to render and the values its queries are
+// expanded with
+type repeatedPanel struct {
+	panel       model.PrometheusDashboardPanel
+	values      map[string]string
+	repeatValue string
+	warning     string
+}
+
+// repeatPanels expands repeated panels into a copy per selected value of their
+// variable, laid out after the panel in its direction. The first copy keeps the
+// panel's ID and the others get -2, -3 and so on. Panels repeating for a variable
+// with no value are rendered once.
+func repeatPanels(panels []model.PrometheusDashboardPanel, resolved *resolvedVariables) []repeatedPanel {
+	var out []repeatedPanel
+	for _, panel := range panels {
+		values := resolved.selected(panel.Repeat)
+		if panel.Repeat == "" || len(values) == 0 {
+			out = append(out, repeatedPanel{panel: panel, values: resolved.values})
+			continue
+		}
+
+		var warning string
+		if len(values) > maxDashboardRepeats {
+			warning = fmt.Sprintf("panel repeats for %d values of $%s; only the first %d are shown", len(values), panel.Repeat, maxDashboardRepeats)
+			values = values[:maxDashboardRepeats]
+		}
+		for k, value := range values {
+			copied := make(map[string]string, len(resolved.values))
+			for name, v := range resolved.values {
+				copied[name] = v
+			}
+			copied[panel.Repeat] = value
+
+			repeat := panel
+			repeat.Title = expandVariables(panel.Title, copied)
+			if k > 0 {
+				repeat.ID = model.DashboardPanelID(fmt.Sprintf("%s-%d", panel.ID, k+1))
+			}
+			repeat.GridPos = repeatGridPos(panel.GridPos, panel.RepeatDirection, k)
+			rp := repeatedPanel{panel: repeat, values: copied, repeatValue: value}
+			if k == 0 {
+				rp.warning = warning
+			}
+			out = append(out, rp)
+		}
+	}
+	return out
+}
+
+// repeatGridPos places the k-th copy of a repeated panel: below the previous one
+// vertically, else beside it, wrapping at the 24th column
+func repeatGridPos(pos *model.DashboardGridPos, direction string, k int) *model.DashboardGridPos {
+	if pos == nil {
+		return nil
+	}
+	p := *pos
+	if direction == "v" {
+		p.Y += k * max(p.H, 1)
+		return &p
+	}
+	w := min(max(p.W, 1), 24)
+	perRow := max((24-p.X)/w, 1)
+	p.X += (k % perRow) * w
+	p.Y += (k / perRow) * max(p.H, 1)
+	return &p
+}
+
+// ValidateDashboardConfig checks a dashboard config before it is saved: its
+// variables must have unique names, supported types, queries and regexes that
+// parse and refer only to the variables before them, its panels unique IDs,
+// valid query builders and repeats of existing variables, and its annotation
+// filter known kinds
+func ValidateDashboardConfig(raw string) error {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	var config model.PrometheusDashboardConfig
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		return fmt.Errorf("%w: not valid JSON: %v", ErrInvalidDashboardConfig, err)
+	}
+
+	defined := make(map[string]bool, len(config.Variables))
+	for i := range config.Variables {
+		v := &config.Variables[i]
+		if !variableName.MatchString(v.Name) || strings.HasPrefix(v.Name, "__") {
+			return fmt.Errorf("%w: invalid variable name %q", ErrInvalidDashboardConfig, v.Name)
+		}
+		if defined[v.Name] {
+			return fmt.Errorf("%w: variable $%s is defined twice", ErrInvalidDashboardConfig, v.Name)
+		}
+		switch v.Type {
+		case model.DashboardVariableQuery:
+			if _, err := parseVariableQuery(v.Query); err != nil {
+				return fmt.Errorf("%w: variable $%s: %v", ErrInvalidDashboardConfig, v.Name, err)
+			}
+			for _, m := range variableReference.FindAllStringSubmatch(v.Query, -1) {
+				name := m[1] + m[2] + m[3]
+				if !defined[name] && !strings.HasPrefix(name, "__") {
+					return fmt.Errorf("%w: variable $%s refers to $%s, which is not defined before it", ErrInvalidDashboardConfig, v.Name, name)
+				}
+			}
+		case model.DashboardVariableCustom, model.DashboardVariableConstant, model.DashboardVariableTextbox, model.DashboardVariableInterval:
+		default:
+			return fmt.Errorf("%w: variable $%s: type must be query, custom, constant, textbox or interval", ErrInvalidDashboardConfig, v.Name)
+		}
+		if _, err := variableRegex(v); err != nil {
+			return fmt.Errorf("%w: variable $%s: invalid regex: %v", ErrInvalidDashboardConfig, v.Name, err)
+		}
+		defined[v.Name] = true
+	}
+
+	if config.AnnotationFilter != nil {
+		for _, kind := range config.AnnotationFilter.Kinds {
+			if !kind.IsValid() {
+				return fmt.Errorf("%w: annotation kind %q is not supported", ErrInvalidDashboardConfig, kind)
+			}
+		}
+	}
+
+	ids := make(map[model.DashboardPanelID]bool, len(config.Panels))
+	for _, panel := range config.Panels {
+		name := panel.Title
+		if name == "" {
+			name = string(panel.ID)
+		}
+		if panel.ID != "" {
+			if ids[panel.ID] {
+				return fmt.Errorf("%w: panel ID %q is used twice", ErrInvalidDashboardConfig, panel.ID)
+			}
+			ids[panel.ID] = true
+		}
+		if panel.Repeat != "" && !defined[panel.Repeat] {
+			return fmt.Errorf("%w: panel %q repeats for $%s, which is not defined", ErrInvalidDashboardConfig, name, panel.Repeat)
+		}
+		if panel.RepeatDirection != "" && panel.RepeatDirection != "h" && panel.RepeatDirection != "v" {
+			return fmt.Errorf("%w: panel %q: repeat direction must be h or v", ErrInvalidDashboardConfig, name)
+		}
+		for j, target := range panel.Targets {
+			if strings.TrimSpace(target.Expr) != "" || target.Builder == nil {
+				continue
+			}
+			if _, err := BuildPromQL(target.Builder); err != nil {
+				return fmt.Errorf("%w: panel %q, %s: %v", ErrInvalidDashboardConfig, name, targetName(target, j), err)
+			}
+		}
+	}
+	return nil
+}
+
+// builtinVariables returns the interval and range variables of Grafana for a render
+func builtinVariables(req *model.DashboardRenderRequest, step time.Duration) map[string]string {
+	span := req.End.Sub(req.Start)
+	return map[string]string{
+		"__interval":      promDuration(step),
+		"__interval_ms":   strconv.FormatInt(step.Milliseconds(), 10),
+		"__rate_interval": promDuration(max(step+minDashboardStep, 4*minDashboardStep)),
+		"__range":         promDuration(span),
+		"__range_s":       strconv.FormatInt(int64(span/time.Second), 10),
+		"__range_ms":      strconv.FormatInt(span.Milliseconds(), 10),
+	}
+}
@@ -0,0 +1,515 @@
+// Package service provides raw data exports of hosts, metrics and alerts
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// JobTypeDataExport is the job that generates a pending data export
+const JobTypeDataExport = "data_export.generate"
+
+// Data export settings
+const (
+	dataExportPruneInterval = 10 * time.Minute
+	defaultDataExportWindow = 24 * time.Hour
+	dataExportJobTimeout    = 15 * time.Minute
+)
+
+var (
+	// ErrDataExportNotFound is returned for exports that do not exist or belong to someone else
+	ErrDataExportNotFound = errors.New("data export not found")
+	// ErrDataExportNotReady is returned when downloading an export that was not generated or expired
+	ErrDataExportNotReady = errors.New("data export is not ready")
+	// ErrDataExportLinkInvalid is returned for download links that are forged or expired
+	ErrDataExportLinkInvalid = errors.New("download link is invalid or has expired")
+	// ErrDataExportTooLarge is returned when an export grows past the size limit
+	ErrDataExportTooLarge = errors.New("data export is too large")
+	// ErrInvalidDataExport is returned for invalid export requests
+	ErrInvalidDataExport = errors.New("invalid data export")
+)
+
+// dataExportJob is the payload of a data_export.generate job
+type dataExportJob struct {
+	ExportID uuid.UUID `json:"exportId"`
+}
+
+// dataExportSource is a dataset exports can contain. Rows streams the rows of
+// an export to emit in order.
+type dataExportSource struct {
+	columns    []exportColumn
+	timeSeries bool
+	rows       func(db *gorm.DB, export *model.DataExport, emit func([]interface{}) error) error
+}
+
+// DataExportService generates exports of raw data on the job queue, serves
+// them through signed links and deletes them once they expire
+type DataExportService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	settings *SettingsService
+	jobs     *JobQueue
+}
+
+// NewDataExportService creates a new data export service and registers the
+// export job with the queue
+func NewDataExportService(db *gorm.DB, logger *zap.Logger, settings *SettingsService, jobs *JobQueue) *DataExportService {
+	s := &DataExportService{db: db, logger: logger, settings: settings, jobs: jobs}
+	jobs.Register(JobTypeDataExport, s.generateJob, JobTypeOptions{MaxAttempts: 3, VisibilityTimeout: dataExportJobTimeout})
+	return s
+}
+
+// Create queues an export of a dataset. The export is pending until the job
+// queue has generated it.
+func (s *DataExportService) Create(userID uuid.UUID, req *model.CreateDataExportRequest) (*model.DataExportResponse, error) {
+	source, ok := dataExportSources[req.Dataset]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown dataset %q", ErrInvalidDataExport, req.Dataset)
+	}
+	if req.Format == "" {
+		req.Format = model.DataExportFormatCSV
+	}
+	if req.Format != model.DataExportFormatCSV && req.Format != model.DataExportFormatParquet {
+		return nil, fmt.Errorf("%w: format must be csv or parquet", ErrInvalidDataExport)
+	}
+
+	export := &model.DataExport{
+		UserID:    userID,
+		Dataset:   req.Dataset,
+		Format:    req.Format,
+		ClusterID: req.ClusterID,
+		Status:    model.DataExportStatusPending,
+	}
+	for _, id := range uniqueUUIDs(req.HostIDs) {
+		export.HostIDs = append(export.HostIDs, id.String())
+	}
+	if source.timeSeries {
+		to := time.Now()
+		if req.To != nil {
+			to = *req.To
+		}
+		from := to.Add(-defaultDataExportWindow)
+		if req.From != nil {
+			from = *req.From
+		}
+		if !from.Before(to) {
+			return nil, fmt.Errorf("%w: from must be before to", ErrInvalidDataExport)
+		}
+		export.From, export.To = &from, &to
+	}
+
+	secret, _, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	export.Secret = secret
+	if err := s.db.Create(export).Error; err != nil {
+		return nil, err
+	}
+	if _, err := s.jobs.Enqueue(JobTypeDataExport, dataExportJob{ExportID: export.ID}, JobOptions{}); err != nil {
+		s.db.Delete(&model.DataExport{}, "id = ?", export.ID)
+		return nil, err
+	}
+	resp := s.response(export)
+	return &resp, nil
+}
+
+// List lists the user's exports, newest first, without their data
+func (s *DataExportService) List(userID uuid.UUID, limit, offset int) ([]model.DataExportResponse, int64, error) {
+	query := s.db.Model(&model.DataExport{}).Where("user_id = ?", userID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var exports []model.DataExport
+	if err := query.Omit("data").Order("created_at DESC").Limit(limit).Offset(offset).Find(&exports).Error; err != nil {
+		return nil, 0, err
+	}
+	resp := make([]model.DataExportResponse, len(exports))
+	for i := range exports {
+		resp[i] = s.response(&exports[i])
+	}
+	return resp, total, nil
+}
+
+// Get gets one of the user's exports with a fresh download link
+func (s *DataExportService) Get(userID, id uuid.UUID) (*model.DataExportResponse, error) {
+	var export model.DataExport
+	if err := s.db.Omit("data").First(&export, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDataExportNotFound
+		}
+		return nil, err
+	}
+	resp := s.response(&export)
+	return &resp, nil
+}
+
+// Delete deletes one of the user's exports, pending ones included
+func (s *DataExportService) Delete(userID, id uuid.UUID) error {
+	result := s.db.Delete(&model.DataExport{}, "id = ? AND user_id = ?", id, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDataExportNotFound
+	}
+	return nil
+}
+
+// Download returns a completed export with its data for a signed link
+func (s *DataExportService) Download(id uuid.UUID, expires, signature string) (*model.DataExport, error) {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return nil, ErrDataExportLinkInvalid
+	}
+	var export model.DataExport
+	if err := s.db.First(&export, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDataExportLinkInvalid
+		}
+		return nil, err
+	}
+	if !hmac.Equal([]byte(signDataExport(&export, expiresAt)), []byte(signature)) {
+		return nil, ErrDataExportLinkInvalid
+	}
+	if export.Status != model.DataExportStatusCompleted || export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) {
+		return nil, ErrDataExportNotReady
+	}
+	return &export, nil
+}
+
+// response adds a download link to a completed export, lasting the link TTL
+// or until the export expires
+func (s *DataExportService) response(export *model.DataExport) model.DataExportResponse {
+	resp := model.DataExportResponse{DataExport: *export}
+	now := time.Now()
+	if export.Status != model.DataExportStatusCompleted || export.ExpiresAt == nil || !export.ExpiresAt.After(now) {
+		return resp
+	}
+	expires := now.Add(s.settings.Duration(model.SettingDataExportLinkTTL))
+	if expires.After(*export.ExpiresAt) {
+		expires = *export.ExpiresAt
+	}
+	resp.DownloadURL = fmt.Sprintf("/api/v1/data-exports/download/%s?expires=%d&signature=%s",
+		export.ID, expires.Unix(), signDataExport(export, expires.Unix()))
+	resp.DownloadExpiresAt = &expires
+	return resp
+}
+
+// signDataExport signs a download link of an export with its secret
+func signDataExport(export *model.DataExport, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(export.Secret))
+	fmt.Fprintf(mac, "%s.%d", export.ID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run deletes expired exports, and failed ones older than the retention
+// setting, until ctx is done
+func (s *DataExportService) Run(ctx context.Context) {
+	ticker := time.NewTicker(dataExportPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if deleted, err := s.Prune(); err != nil {
+			s.logger.Error("failed to prune data exports", zap.Error(err))
+		} else if deleted > 0 {
+			s.logger.Info("pruned data exports", zap.Int64("deleted", deleted))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune deletes expired exports and returns the number deleted
+func (s *DataExportService) Prune() (int64, error) {
+	now := time.Now()
+	result := s.db.Where("expires_at < ? OR (status = ? AND created_at < ?)",
+		now, model.DataExportStatusFailed, now.Add(-s.settings.Duration(model.SettingDataExportRetention))).
+		Delete(&model.DataExport{})
+	return result.RowsAffected, result.Error
+}
+
+// ============== Generation ==============
+
+// generateJob encodes the rows of a pending export. An export past the size
+// limit fails at once; other failures are retried and the export fails with
+// the last attempt.
+func (s *DataExportService) generateJob(ctx context.Context, job *model.Job) error {
+	var payload dataExportJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	var export model.DataExport
+	if err := s.db.Omit("data").First(&export, "id = ?", payload.ExportID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // Deleted while queued
+		}
+		return err
+	}
+	if export.Status != model.DataExportStatusPending {
+		return nil
+	}
+
+	data, rows, err := s.encode(ctx, &export)
+	now := time.Now()
+	if err != nil {
+		tooLarge := errors.Is(err, ErrDataExportTooLarge)
+		if tooLarge || job.Attempts >= job.MaxAttempts {
+			s.db.Model(&model.DataExport{}).Where("id = ? AND status = ?", export.ID, model.DataExportStatusPending).
+				Updates(map[string]interface{}{"status": model.DataExportStatusFailed, "error": err.Error(), "completed_at": now})
+		}
+		if tooLarge {
+			return nil
+		}
+		return err
+	}
+	return s.db.Model(&model.DataExport{}).Where("id = ? AND status = ?", export.ID, model.DataExportStatusPending).
+		Updates(map[string]interface{}{
+			"status":       model.DataExportStatusCompleted,
+			"data":         data,
+			"rows":         rows,
+			"size_bytes":   len(data),
+			"completed_at": now,
+			"expires_at":   now.Add(s.settings.Duration(model.SettingDataExportRetention)),
+		}).Error
+}
+
+// encode writes the rows of an export's dataset in its format, failing once
+// the file passes the size limit
+func (s *DataExportService) encode(ctx context.Context, export *model.DataExport) ([]byte, int64, error) {
+	source, ok := dataExportSources[export.Dataset]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown dataset %q", export.Dataset)
+	}
+	var w dataExportWriter = newCSVExportWriter(source.columns)
+	if export.Format == model.DataExportFormatParquet {
+		w = newParquetExportWriter(source.columns)
+	}
+
+	maxBytes := s.settings.Int(model.SettingDataExportMaxBytes)
+	tooLarge := fmt.Errorf("%w: larger than %d bytes, narrow the time range or hosts", ErrDataExportTooLarge, maxBytes)
+	var rows int64
+	err := source.rows(s.db.WithContext(ctx), export, func(row []interface{}) error {
+		if err := w.Write(row); err != nil {
+			return err
+		}
+		rows++
+		if w.Size() > maxBytes {
+			return tooLarge
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := w.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(data) > maxBytes {
+		return nil, 0, tooLarge
+	}
+	return data, rows, nil
+}
+
+// dataExportSources are the datasets exports can contain
+var dataExportSources = map[model.DataExportDataset]dataExportSource{
+	model.DataExportHosts: {
+		columns: []exportColumn{
+			{"id", exportString}, {"hostname", exportString}, {"ip_address", exportString}, {"port", exportInt64},
+			{"status", exportString}, {"lifecycle", exportString}, {"os_type", exportString}, {"os_version", exportString},
+			{"cpu_cores", exportInt64}, {"memory_gb", exportInt64}, {"disk_gb", exportInt64},
+			{"cluster_id", exportString}, {"tags", exportString}, {"labels", exportString},
+			{"last_seen_at", exportTime}, {"created_at", exportTime},
+		},
+		rows: exportHosts,
+	},
+	model.DataExportHostMetrics: {
+		columns: []exportColumn{
+			{"timestamp", exportTime}, {"host_id", exportString}, {"hostname", exportString},
+			{"cpu_usage_percent", exportFloat64}, {"load1", exportFloat64}, {"load5", exportFloat64}, {"load15", exportFloat64},
+			{"memory_used_bytes", exportInt64}, {"memory_available_bytes", exportInt64}, {"swap_used_bytes", exportInt64},
+			{"disk_usage_percent", exportFloat64},
+		},
+		timeSeries: true,
+		rows:       exportHostMetrics,
+	},
+	model.DataExportClusterMetrics: {
+		columns: []exportColumn{
+			{"timestamp", exportTime}, {"cluster_id", exportString}, {"cluster", exportString},
+			{"cpu_usage_percent", exportFloat64}, {"memory_usage_bytes", exportInt64}, {"memory_total_bytes", exportInt64},
+			{"nodes", exportInt64}, {"ready_nodes", exportInt64}, {"pods", exportInt64},
+			{"running_pods", exportInt64}, {"pending_pods", exportInt64}, {"failed_pods", exportInt64},
+		},
+		timeSeries: true,
+		rows:       exportClusterMetrics,
+	},
+	model.DataExportAlerts: {
+		columns: []exportColumn{
+			{"id", exportString}, {"rule_id", exportString}, {"status", exportString}, {"severity", exportString},
+			{"title", exportString}, {"value", exportFloat64}, {"threshold", exportFloat64},
+			{"cluster_id", exportString}, {"host_id", exportString}, {"labels", exportString},
+			{"started_at", exportTime}, {"acknowledged_at", exportTime}, {"resolved_at", exportTime},
+		},
+		timeSeries: true,
+		rows:       exportAlerts,
+	},
+}
+
+// streamRows runs a query and emits a row built from each record it returns,
+// without loading them all at once
+func streamRows[T any](db *gorm.DB, query *gorm.DB, build func(*T) []interface{}, emit func([]interface{}) error) error {
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var record T
+		if err := db.ScanRows(rows, &record); err != nil {
+			return err
+		}
+		if err := emit(build(&record)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func exportHosts(db *gorm.DB, export *model.DataExport, emit func([]interface{}) error) error {
+	query := db.Model(&model.Host{}).Order("hostname, id")
+	if len(export.HostIDs) > 0 {
+		query = query.Where("id IN ?", []string(export.HostIDs))
+	}
+	if export.ClusterID != nil {
+		query = query.Where("cluster_id = ?", *export.ClusterID)
+	}
+	return streamRows(db, query, func(h *model.Host) []interface{} {
+		labels, _ := json.Marshal(h.Labels)
+		return []interface{}{
+			h.ID.String(), h.Hostname, h.IPAddress, int64(h.Port), string(h.Status), string(h.Lifecycle), h.OSType, h.OSVersion,
+			optionalInt(h.CPUCores), optionalInt(h.MemoryGB), optionalInt64(h.DiskGB),
+			optionalUUIDValue(h.ClusterID), strings.Join(h.Tags, ","), string(labels),
+			optionalTime(h.LastSeenAt), h.CreatedAt,
+		}
+	}, emit)
+}
+
+func exportHostMetrics(db *gorm.DB, export *model.DataExport, emit func([]interface{}) error) error {
+	var hosts []model.Host
+	if err := db.Select("id, hostname").Find(&hosts).Error; err != nil {
+		return err
+	}
+	hostnames := make(map[uuid.UUID]string, len(hosts))
+	for _, h := range hosts {
+		hostnames[h.ID] = h.Hostname
+	}
+
+	query := db.Model(&model.HostMetric{}).
+		Where("timestamp >= ? AND timestamp < ?", export.From.Unix(), export.To.Unix()).
+		Order("timestamp, host_id")
+	if len(export.HostIDs) > 0 {
+		query = query.Where("host_id IN ?", []string(export.HostIDs))
+	}
+	return streamRows(db, query, func(m *model.HostMetric) []interface{} {
+		return []interface{}{
+			time.Unix(m.Timestamp, 0), m.HostID.String(), hostnames[m.HostID],
+			m.CPUUsagePercent, m.Load1, m.Load5, m.Load15,
+			m.MemoryUsedBytes, m.MemoryAvailableBytes, m.SwapUsedBytes, m.DiskUsagePercent,
+		}
+	}, emit)
+}
+
+func exportClusterMetrics(db *gorm.DB, export *model.DataExport, emit func([]interface{}) error) error {
+	var clusters []model.K8sCluster
+	if err := db.Select("id, name").Find(&clusters).Error; err != nil {
+		return err
+	}
+	names := make(map[uuid.UUID]string, len(clusters))
+	for _, c := range clusters {
+		names[c.ID] = c.Name
+	}
+
+	query := db.Model(&model.ClusterMetric{}).
+		Where("timestamp >= ? AND timestamp < ?", export.From.Unix(), export.To.Unix()).
+		Order("timestamp, cluster_id")
+	if export.ClusterID != nil {
+		query = query.Where("cluster_id = ?", *export.ClusterID)
+	}
+	return streamRows(db, query, func(m *model.ClusterMetric) []interface{} {
+		return []interface{}{
+			time.Unix(m.Timestamp, 0), m.ClusterID.String(), names[m.ClusterID],
+			m.CPUUsagePercent, m.MemoryUsageBytes, m.MemoryTotalBytes,
+			int64(m.NodeCount), int64(m.ReadyNodeCount), int64(m.PodCount),
+			int64(m.RunningPodCount), int64(m.PendingPodCount), int64(m.FailedPodCount),
+		}
+	}, emit)
+}
+
+// exportAlerts exports the alerts of the export's owner that started in its period
+func exportAlerts(db *gorm.DB, export *model.DataExport, emit func([]interface{}) error) error {
+	query := db.Model(&model.Alert{}).
+		Where("user_id = ? AND started_at >= ? AND started_at < ?", export.UserID, *export.From, *export.To).
+		Order("started_at, id")
+	if len(export.HostIDs) > 0 {
+		query = query.Where("host_id IN ?", []string(export.HostIDs))
+	}
+	if export.ClusterID != nil {
+		query = query.Where("cluster_id = ?", *export.ClusterID)
+	}
+	return streamRows(db, query, func(a *model.Alert) []interface{} {
+		return []interface{}{
+			a.ID.String(), a.RuleID.String(), string(a.Status), string(a.Severity),
+			a.Title, a.Value, a.Threshold,
+			optionalUUIDValue(a.ClusterID), optionalUUIDValue(a.HostID), a.Labels,
+			a.StartedAt, optionalTime(a.AcknowledgedAt), optionalTime(a.ResolvedAt),
+		}
+	}, emit)
+}
+
+// Optional values of export rows, nil when unset
+
+func optionalInt(v *int) interface{} {
+	if v == nil {
+		return nil
+	}
+	return int64(*v)
+}
+
+func optionalInt64(v *int64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func optionalUUIDValue(v *uuid.UUID) interface{} {
+	if v == nil {
+		return nil
+	}
+	return v.String()
+}
+
+func optionalTime(v *time.Time) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
@@ -0,0 +1,394 @@
+// Package service provides the CSV and Parquet encodings of data exports
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"math"
+	"strconv"
+	"time"
+)
+
+// exportColumnType is the type of the values of an export column. Values are
+// nil, or a string, int64, float64, bool or time.Time respectively.
+type exportColumnType int
+
+const (
+	exportString exportColumnType = iota
+	exportInt64
+	exportFloat64
+	exportBool
+	exportTime
+)
+
+// exportColumn is a column of an exported dataset
+type exportColumn struct {
+	Name string
+	Type exportColumnType
+}
+
+// dataExportWriter encodes the rows of an export
+type dataExportWriter interface {
+	Write(row []interface{}) error
+	Size() int // Bytes encoded so far
+	Close() ([]byte, error)
+}
+
+// ============== CSV ==============
+
+// csvExportWriter writes a header row and then a record per row, with empty
+// fields for nulls and RFC 3339 UTC times
+type csvExportWriter struct {
+	buf    bytes.Buffer
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVExportWriter(columns []exportColumn) *csvExportWriter {
+	cw := &csvExportWriter{record: make([]string, len(columns))}
+	cw.w = csv.NewWriter(&cw.buf)
+	for i, c := range columns {
+		cw.record[i] = c.Name
+	}
+	cw.w.Write(cw.record)
+	return cw
+}
+
+func (cw *csvExportWriter) Write(row []interface{}) error {
+	for i, v := range row {
+		switch v := v.(type) {
+		case nil:
+			cw.record[i] = ""
+		case string:
+			cw.record[i] = v
+		case int64:
+			cw.record[i] = strconv.FormatInt(v, 10)
+		case float64:
+			cw.record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			cw.record[i] = strconv.FormatBool(v)
+		case time.Time:
+			cw.record[i] = v.UTC().Format(time.RFC3339)
+		}
+	}
+	return cw.w.Write(cw.record)
+}
+
+func (cw *csvExportWriter) Size() int {
+	cw.w.Flush()
+	return cw.buf.Len()
+}
+
+func (cw *csvExportWriter) Close() ([]byte, error) {
+	cw.w.Flush()
+	return cw.buf.Bytes(), cw.w.Error()
+}
+
+// ============== Parquet ==============
+
+// Parquet physical and converted types, encodings and page types, from the
+// format's Thrift definitions
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+
+	parquetOptional      = 1
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+	parquetDataPage      = 0
+	parquetUncompressed  = 0
+)
+
+// parquetColumn holds the encoded values of a column and whether each row has one
+type parquetColumn struct {
+	values  bytes.Buffer // PLAIN encoded values other than booleans
+	bools   []bool
+	defined []bool
+}
+
+// parquetExportWriter writes an uncompressed Parquet file with one row group
+// and one data page per column, every column optional. It covers what exports
+// need and nothing more.
+type parquetExportWriter struct {
+	columns []exportColumn
+	chunks  []parquetColumn
+	rows    int64
+}
+
+func newParquetExportWriter(columns []exportColumn) *parquetExportWriter {
+	return &parquetExportWriter{columns: columns, chunks: make([]parquetColumn, len(columns))}
+}
+
+func (pw *parquetExportWriter) Write(row []interface{}) error {
+	var scratch [8]byte
+	for i, v := range row {
+		c := &pw.chunks[i]
+		c.defined = append(c.defined, v != nil)
+		switch v := v.(type) {
+		case string:
+			binary.LittleEndian.PutUint32(scratch[:4], uint32(len(v)))
+			c.values.Write(scratch[:4])
+			c.values.WriteString(v)
+		case int64:
+			binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+			c.values.Write(scratch[:])
+		case float64:
+			binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+			c.values.Write(scratch[:])
+		case bool:
+			c.bools = append(c.bools, v)
+		case time.Time:
+			binary.LittleEndian.PutUint64(scratch[:], uint64(v.UnixMilli()))
+			c.values.Write(scratch[:])
+		}
+	}
+	pw.rows++
+	return nil
+}
+
+func (pw *parquetExportWriter) Size() int {
+	size := 0
+	for i := range pw.chunks {
+		size += pw.chunks[i].values.Len() + (len(pw.chunks[i].bools)+len(pw.chunks[i].defined))/8
+	}
+	return size
+}
+
+func (pw *parquetExportWriter) Close() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString("PAR1")
+
+	offsets := make([]int64, len(pw.columns))
+	sizes := make([]int64, len(pw.columns))
+	for i := range pw.columns {
+		page := pw.chunks[i].page()
+		var header thriftCompact
+		header.structBegin()
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(page)))
+		header.structField(5) // DataPageHeader
+		header.i32(1, int32(pw.rows))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.structEnd()
+		header.structEnd()
+
+		offsets[i] = int64(out.Len())
+		sizes[i] = int64(header.Len() + len(page))
+		out.Write(header.Bytes())
+		out.Write(page)
+	}
+
+	footer := pw.footer(offsets, sizes)
+	out.Write(footer)
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	out.Write(length[:])
+	out.WriteString("PAR1")
+	return out.Bytes(), nil
+}
+
+// page is the data page of a column: the definition levels, RLE encoded with a
+// length prefix, then the values that are set
+func (c *parquetColumn) page() []byte {
+	var levels bytes.Buffer
+	for i := 0; i < len(c.defined); {
+		run := 1
+		for i+run < len(c.defined) && c.defined[i+run] == c.defined[i] {
+			run++
+		}
+		writeUvarint(&levels, uint64(run)<<1)
+		if c.defined[i] {
+			levels.WriteByte(1)
+		} else {
+			levels.WriteByte(0)
+		}
+		i += run
+	}
+
+	var page bytes.Buffer
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(levels.Len()))
+	page.Write(length[:])
+	page.Write(levels.Bytes())
+	if len(c.bools) > 0 {
+		packed := make([]byte, (len(c.bools)+7)/8)
+		for i, b := range c.bools {
+			if b {
+				packed[i/8] |= 1 << (i % 8)
+			}
+		}
+		page.Write(packed)
+	}
+	page.Write(c.values.Bytes())
+	return page.Bytes()
+}
+
+// footer is the FileMetaData of the file
+func (pw *parquetExportWriter) footer(offsets, sizes []int64) []byte {
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+
+	var t thriftCompact
+	t.structBegin()
+	t.i32(1, 1) // version
+	t.listBegin(2, thriftStruct, len(pw.columns)+1)
+	t.structBegin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(pw.columns)))
+	t.structEnd()
+	for _, c := range pw.columns {
+		physical, converted := parquetTypes(c.Type)
+		t.structBegin()
+		t.i32(1, physical)
+		t.i32(3, parquetOptional)
+		t.binary(4, c.Name)
+		if converted >= 0 {
+			t.i32(6, converted)
+		}
+		t.structEnd()
+	}
+	t.i64(3, pw.rows)
+
+	t.listBegin(4, thriftStruct, 1)
+	t.structBegin()
+	t.listBegin(1, thriftStruct, len(pw.columns))
+	for i, c := range pw.columns {
+		physical, _ := parquetTypes(c.Type)
+		t.structBegin()
+		t.i64(2, offsets[i])
+		t.structField(3) // ColumnMetaData
+		t.i32(1, physical)
+		t.listBegin(2, thriftI32, 2)
+		t.listI32(parquetEncodingPlain)
+		t.listI32(parquetEncodingRLE)
+		t.listBegin(3, thriftBinary, 1)
+		t.listBinary(c.Name)
+		t.i32(4, parquetUncompressed)
+		t.i64(5, pw.rows)
+		t.i64(6, sizes[i])
+		t.i64(7, sizes[i])
+		t.i64(9, offsets[i])
+		t.structEnd()
+		t.structEnd()
+	}
+	t.i64(2, total)
+	t.i64(3, pw.rows)
+	t.structEnd()
+
+	t.binary(6, "myops")
+	t.structEnd()
+	return t.Bytes()
+}
+
+// parquetTypes returns the physical and converted type of a column type; the
+// converted type is -1 when there is none
+func parquetTypes(typ exportColumnType) (int32, int32) {
+	switch typ {
+	case exportInt64:
+		return parquetInt64, -1
+	case exportFloat64:
+		return parquetDouble, -1
+	case exportBool:
+		return parquetBoolean, -1
+	case exportTime:
+		return parquetInt64, parquetConvertedTimestampMillis
+	default:
+		return parquetByteArray, parquetConvertedUTF8
+	}
+}
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftCompact encodes structs in the Thrift compact protocol Parquet
+// metadata is written in
+type thriftCompact struct {
+	bytes.Buffer
+	lastField []int16
+}
+
+func (t *thriftCompact) structBegin() {
+	t.lastField = append(t.lastField, 0)
+}
+
+func (t *thriftCompact) structEnd() {
+	t.WriteByte(0)
+	t.lastField = t.lastField[:len(t.lastField)-1]
+}
+
+func (t *thriftCompact) fieldHeader(id int16, typ byte) {
+	last := &t.lastField[len(t.lastField)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.WriteByte(typ)
+		writeUvarint(&t.Buffer, zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (t *thriftCompact) structField(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.structBegin()
+}
+
+func (t *thriftCompact) i32(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	writeUvarint(&t.Buffer, zigzag(int64(v)))
+}
+
+func (t *thriftCompact) i64(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	writeUvarint(&t.Buffer, zigzag(v))
+}
+
+func (t *thriftCompact) binary(id int16, s string) {
+	t.fieldHeader(id, thriftBinary)
+	t.listBinary(s)
+}
+
+// listBegin starts a list field; its elements follow without field headers
+func (t *thriftCompact) listBegin(id int16, elem byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.WriteByte(byte(size)<<4 | elem)
+		return
+	}
+	t.WriteByte(0xf0 | elem)
+	writeUvarint(&t.Buffer, uint64(size))
+}
+
+func (t *thriftCompact) listI32(v int32) {
+	writeUvarint(&t.Buffer, zigzag(int64(v)))
+}
+
+func (t *thriftCompact) listBinary(s string) {
+	writeUvarint(&t.Buffer, uint64(len(s)))
+	t.WriteString(s)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	buf.Write(scratch[:binary.PutUvarint(scratch[:], v)])
+}
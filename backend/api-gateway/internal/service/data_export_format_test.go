@@ -0,0 +1,348 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// thriftReader decodes the Thrift compact protocol into maps of field ID to
+// value, independently of thriftCompact, so the tests check the encoding
+// against the protocol rather than against the encoder
+type thriftReader struct {
+	t    *testing.T
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) next(n int) []byte {
+	r.t.Helper()
+	if n < 0 || r.pos+n > len(r.data) {
+		r.t.Fatalf("thrift: reading %d bytes at %d of %d", n, r.pos, len(r.data))
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	r.t.Helper()
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.t.Fatalf("thrift: bad varint at %d", r.pos)
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	r.t.Helper()
+	fields := map[int16]interface{}{}
+	var last int16
+	for {
+		header := r.next(1)[0]
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.varint())
+		}
+		last = id
+		switch typ := header & 0x0f; typ {
+		case 1, 2: // booleans are carried by the field header
+			fields[id] = typ == 1
+		default:
+			fields[id] = r.value(typ)
+		}
+	}
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	r.t.Helper()
+	switch typ {
+	case 1, 2: // list element booleans take a byte
+		return r.next(1)[0] == 1
+	case 3:
+		return int64(int8(r.next(1)[0]))
+	case 4, 5, 6:
+		return r.varint()
+	case 7:
+		return math.Float64frombits(binary.LittleEndian.Uint64(r.next(8)))
+	case 8:
+		return string(r.next(int(r.uvarint())))
+	case 9, 10:
+		header := r.next(1)[0]
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		elems := make([]interface{}, size)
+		for i := range elems {
+			elems[i] = r.value(header & 0x0f)
+		}
+		return elems
+	case 12:
+		return r.readStruct()
+	default:
+		r.t.Fatalf("thrift: unsupported type %d at %d", typ, r.pos)
+		return nil
+	}
+}
+
+// parquetTestColumn is a column read back from a Parquet file
+type parquetTestColumn struct {
+	name       string
+	physical   int64
+	converted  interface{} // nil without a converted type
+	repetition int64
+	values     []interface{}
+}
+
+// readParquet reads the row count and columns of a file laid out as Parquet's
+// format specification describes
+func readParquet(t *testing.T, data []byte) (int64, []parquetTestColumn) {
+	t.Helper()
+	if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatalf("missing PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{t: t, data: data[len(data)-8-footerLen : len(data)-8]}
+	meta := footer.readStruct()
+	if footer.pos != len(footer.data) {
+		t.Fatalf("footer has %d trailing bytes", len(footer.data)-footer.pos)
+	}
+
+	numRows := meta[3].(int64)
+	schema := meta[2].([]interface{})
+	root := schema[0].(map[int16]interface{})
+	if int(root[5].(int64)) != len(schema)-1 {
+		t.Fatalf("root has %v children, schema has %d columns", root[5], len(schema)-1)
+	}
+	rowGroups := meta[4].([]interface{})
+	if len(rowGroups) != 1 {
+		t.Fatalf("got %d row groups", len(rowGroups))
+	}
+	rowGroup := rowGroups[0].(map[int16]interface{})
+	if rowGroup[3].(int64) != numRows {
+		t.Fatalf("row group has %v rows, file has %d", rowGroup[3], numRows)
+	}
+	chunks := rowGroup[1].([]interface{})
+	if len(chunks) != len(schema)-1 {
+		t.Fatalf("got %d column chunks for %d columns", len(chunks), len(schema)-1)
+	}
+
+	columns := make([]parquetTestColumn, len(chunks))
+	for i, chunk := range chunks {
+		element := schema[i+1].(map[int16]interface{})
+		column := parquetTestColumn{
+			name:       element[4].(string),
+			physical:   element[1].(int64),
+			converted:  element[6],
+			repetition: element[3].(int64),
+		}
+		metaData := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+		if path := metaData[3].([]interface{}); len(path) != 1 || path[0] != column.name {
+			t.Fatalf("column %d has path %v, schema names it %s", i, path, column.name)
+		}
+		if metaData[1].(int64) != column.physical || metaData[4].(int64) != parquetUncompressed || metaData[5].(int64) != numRows {
+			t.Fatalf("column %s metadata %v does not match its schema", column.name, metaData)
+		}
+
+		pages := &thriftReader{t: t, data: data, pos: int(metaData[9].(int64))}
+		header := pages.readStruct()
+		if header[1].(int64) != parquetDataPage || header[2] != header[3] {
+			t.Fatalf("column %s page header %v", column.name, header)
+		}
+		page := pages.next(int(header[3].(int64)))
+		if int64(pages.pos)-metaData[9].(int64) != metaData[7].(int64) {
+			t.Fatalf("column %s chunk is %d bytes, metadata says %v", column.name, int64(pages.pos)-metaData[9].(int64), metaData[7])
+		}
+		dataPage := header[5].(map[int16]interface{})
+		if dataPage[2].(int64) != parquetEncodingPlain || dataPage[3].(int64) != parquetEncodingRLE {
+			t.Fatalf("column %s page encodings %v", column.name, dataPage)
+		}
+
+		levelsLen := int(binary.LittleEndian.Uint32(page))
+		defined := decodeLevels(t, page[4:4+levelsLen], int(dataPage[1].(int64)))
+		column.values = decodePlain(t, page[4+levelsLen:], column, defined)
+		columns[i] = column
+	}
+	return numRows, columns
+}
+
+// decodeLevels decodes n definition levels of bit width 1 in the RLE and bit
+// packing hybrid encoding
+func decodeLevels(t *testing.T, data []byte, n int) []bool {
+	t.Helper()
+	r := &thriftReader{t: t, data: data}
+	var levels []bool
+	for len(levels) < n {
+		header := r.uvarint()
+		if header&1 == 0 {
+			value := r.next(1)[0] == 1
+			for i := uint64(0); i < header>>1; i++ {
+				levels = append(levels, value)
+			}
+			continue
+		}
+		for _, b := range r.next(int(header >> 1)) {
+			for bit := 0; bit < 8; bit++ {
+				levels = append(levels, b&(1<<bit) != 0)
+			}
+		}
+	}
+	if r.pos != len(data) {
+		t.Fatalf("definition levels have %d trailing bytes", len(data)-r.pos)
+	}
+	return levels[:n]
+}
+
+// decodePlain decodes the PLAIN encoded values of a column, nil where a row has none
+func decodePlain(t *testing.T, data []byte, column parquetTestColumn, defined []bool) []interface{} {
+	t.Helper()
+	r := &thriftReader{t: t, data: data}
+	values := make([]interface{}, len(defined))
+	var bit int
+	for i, ok := range defined {
+		if !ok {
+			continue
+		}
+		switch column.physical {
+		case parquetBoolean:
+			values[i] = data[bit/8]&(1<<(bit%8)) != 0
+			bit++
+		case parquetInt64:
+			v := int64(binary.LittleEndian.Uint64(r.next(8)))
+			if column.converted == int64(parquetConvertedTimestampMillis) {
+				values[i] = time.UnixMilli(v).UTC()
+			} else {
+				values[i] = v
+			}
+		case parquetDouble:
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(r.next(8)))
+		case parquetByteArray:
+			values[i] = string(r.next(int(binary.LittleEndian.Uint32(r.next(4)))))
+		default:
+			t.Fatalf("column %s has physical type %d", column.name, column.physical)
+		}
+	}
+	consumed := r.pos
+	if column.physical == parquetBoolean {
+		consumed = (bit + 7) / 8
+	}
+	if consumed != len(data) {
+		t.Fatalf("column %s has %d trailing value bytes", column.name, len(data)-consumed)
+	}
+	return values
+}
+
+func TestParquetExportWriterRoundTrip(t *testing.T) {
+	types := []exportColumnType{exportString, exportInt64, exportFloat64, exportBool, exportTime}
+	var columns []exportColumn
+	for i := 0; i < 17; i++ {
+		columns = append(columns, exportColumn{Name: fmt.Sprintf("col_%02d", i), Type: types[i%len(types)]})
+	}
+
+	base := time.Date(2026, 3, 14, 15, 9, 26, 535_000_000, time.UTC)
+	var rows [][]interface{}
+	for r := 0; r < 21; r++ {
+		row := make([]interface{}, len(columns))
+		for i, c := range columns {
+			if (r*7+i)%4 == 0 || r == 20 {
+				continue // nulls, runs of them, and a row of only nulls
+			}
+			switch c.Type {
+			case exportString:
+				row[i] = []string{"", "ünïcode", fmt.Sprintf("value %d/%d", r, i)}[r%3]
+			case exportInt64:
+				row[i] = int64(r*1000+i) * int64(1-2*(r%2))
+			case exportFloat64:
+				row[i] = float64(r) * -1.25
+			case exportBool:
+				row[i] = (r+i)%3 != 0
+			case exportTime:
+				row[i] = base.Add(time.Duration(r*i) * time.Hour).Add(time.Duration(r) * time.Millisecond)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	w := newParquetExportWriter(columns)
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	data, err := w.Close()
+	if err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	numRows, got := readParquet(t, data)
+	if numRows != int64(len(rows)) {
+		t.Fatalf("file has %d rows, want %d", numRows, len(rows))
+	}
+	if len(got) != len(columns) {
+		t.Fatalf("file has %d columns, want %d", len(got), len(columns))
+	}
+	for i, c := range columns {
+		physical, converted := parquetTypes(c.Type)
+		col := got[i]
+		if col.name != c.Name || col.physical != int64(physical) || col.repetition != parquetOptional {
+			t.Errorf("column %d = %s type %d repetition %d, want %s type %d optional", i, col.name, col.physical, col.repetition, c.Name, physical)
+		}
+		if converted >= 0 && col.converted != int64(converted) || converted < 0 && col.converted != nil {
+			t.Errorf("column %s converted type = %v, want %d", c.Name, col.converted, converted)
+		}
+		for r, row := range rows {
+			want := row[i]
+			if ts, ok := want.(time.Time); ok {
+				if ts.Equal(col.values[r].(time.Time)) {
+					continue
+				}
+			} else if col.values[r] == want {
+				continue
+			}
+			t.Errorf("column %s row %d = %#v, want %#v", c.Name, r, col.values[r], want)
+		}
+	}
+}
+
+func TestThriftCompactListSizes(t *testing.T) {
+	for _, size := range []int{0, 1, 14, 15, 16, 200} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			var enc thriftCompact
+			enc.structBegin()
+			enc.listBegin(1, thriftI32, size)
+			for i := 0; i < size; i++ {
+				enc.listI32(int32(i - size/2))
+			}
+			enc.i64(40, -7) // a field ID delta too large for the short header
+			enc.structEnd()
+
+			r := &thriftReader{t: t, data: enc.Bytes()}
+			fields := r.readStruct()
+			list := fields[1].([]interface{})
+			if len(list) != size {
+				t.Fatalf("list has %d elements, want %d", len(list), size)
+			}
+			for i, v := range list {
+				if v != int64(i-size/2) {
+					t.Fatalf("element %d = %v, want %d", i, v, i-size/2)
+				}
+			}
+			if fields[40] != int64(-7) || !bytes.Equal(r.data[r.pos:], nil) {
+				t.Fatalf("field 40 = %v with %d trailing bytes", fields[40], len(r.data)-r.pos)
+			}
+		})
+	}
+}
@@ -0,0 +1,456 @@
+// Package service provides management of Prometheus data sources and their alerting rules
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+var (
+	// ErrInvalidPrometheusDataSource is returned when a data source's settings are malformed
+	ErrInvalidPrometheusDataSource = errors.New("invalid data source")
+	// ErrPrometheusDataSourceExists is returned when the user already has a data source with the name
+	ErrPrometheusDataSourceExists = errors.New("data source name already exists")
+	// ErrPrometheusAlertRuleNotFound is returned when the user has no such alerting rule
+	ErrPrometheusAlertRuleNotFound = errors.New("alert rule not found")
+	// ErrPrometheusAlertRuleExists is returned when the data source already has a rule with the name
+	ErrPrometheusAlertRuleExists = errors.New("alert rule name already exists for this data source")
+)
+
+// DataSourceService manages the Prometheus-compatible data sources users query
+type DataSourceService struct {
+	dataSources DataSourceRepository
+	clusters    ClusterRepository
+}
+
+// NewDataSourceService creates a new data source service
+func NewDataSourceService(dataSources DataSourceRepository, clusters ClusterRepository) *DataSourceService {
+	return &DataSourceService{dataSources: dataSources, clusters: clusters}
+}
+
+// Create adds a data source, optionally attached to one of the user's clusters
+func (s *DataSourceService) Create(ctx context.Context, userID uuid.UUID, req *model.CreatePrometheusDataSourceRequest) (*model.PrometheusDataSource, error) {
+	if err := ownCluster(ctx, s.clusters, req.ClusterID, userID); err != nil {
+		return nil, err
+	}
+	flavor, err := dataSourceFlavor(req.Flavor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkName(ctx, userID, req.Name, uuid.Nil); err != nil {
+		return nil, err
+	}
+	var members []string
+	if flavor == model.DSFlavorVirtual {
+		sources, err := s.members(ctx, userID, uuid.Nil, req.MemberIDs)
+		if err != nil {
+			return nil, err
+		}
+		members = dataSourceIDs(sources)
+	}
+
+	dataSource := &model.PrometheusDataSource{
+		UserID:          userID,
+		ClusterID:       req.ClusterID,
+		Name:            req.Name,
+		URL:             req.URL,
+		Username:        req.Username,
+		Password:        req.Password,
+		Status:          model.DSStatusActive,
+		InsecureSkipTLS: req.InsecureSkipTLS,
+		CACert:          req.CACert,
+		ClientCert:      req.ClientCert,
+		ClientKey:       req.ClientKey,
+		Headers:         req.Headers,
+		Flavor:          flavor,
+		TenantID:        req.TenantID,
+		PartialResponse: req.PartialResponse,
+		MemberIDs:       members,
+	}
+	if flavor == model.DSFlavorVirtual {
+		dataSource.URL = ""
+	}
+	if err := s.dataSources.Create(ctx, dataSource); err != nil {
+		return nil, err
+	}
+	return dataSource, nil
+}
+
+// Get returns one of the user's data sources with its cluster
+func (s *DataSourceService) Get(ctx context.Context, id, userID uuid.UUID) (*model.PrometheusDataSource, error) {
+	dataSource, err := s.dataSources.FindOwned(ctx, id, userID)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, ErrPrometheusDataSourceNotFound
+	}
+	return dataSource, err
+}
+
+// List returns a page of the user's data sources and how many match the filter
+func (s *DataSourceService) List(ctx context.Context, filter *db.DataSourceFilter) ([]model.PrometheusDataSource, int64, error) {
+	return s.dataSources.List(ctx, filter)
+}
+
+// Update changes the fields set in req
+func (s *DataSourceService) Update(ctx context.Context, id, userID uuid.UUID, req *model.UpdatePrometheusDataSourceRequest) (*model.PrometheusDataSource, error) {
+	dataSource, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	if req.Name != nil && *req.Name != dataSource.Name {
+		if err := s.checkName(ctx, userID, *req.Name, id); err != nil {
+			return nil, err
+		}
+		dataSource.Name = *req.Name
+		fields = append(fields, "Name")
+	}
+	if req.URL != nil {
+		dataSource.URL = *req.URL
+		fields = append(fields, "URL")
+	}
+	if req.Username != nil {
+		dataSource.Username = *req.Username
+		fields = append(fields, "Username")
+	}
+	if req.Password != nil {
+		dataSource.Password = *req.Password
+		fields = append(fields, "Password")
+	}
+	if req.InsecureSkipTLS != nil {
+		dataSource.InsecureSkipTLS = *req.InsecureSkipTLS
+		fields = append(fields, "InsecureSkipTLS")
+	}
+	if req.CACert != nil {
+		dataSource.CACert = *req.CACert
+		fields = append(fields, "CACert")
+	}
+	if req.ClientCert != nil {
+		dataSource.ClientCert = *req.ClientCert
+		fields = append(fields, "ClientCert")
+	}
+	if req.ClientKey != nil {
+		dataSource.ClientKey = *req.ClientKey
+		fields = append(fields, "ClientKey")
+	}
+	if req.Headers != nil {
+		dataSource.Headers = *req.Headers
+		fields = append(fields, "Headers")
+	}
+	if req.Status != nil {
+		dataSource.Status = *req.Status
+		fields = append(fields, "Status")
+	}
+	if req.Flavor != nil {
+		if dataSource.Flavor, err = dataSourceFlavor(*req.Flavor); err != nil {
+			return nil, err
+		}
+		fields = append(fields, "Flavor")
+	}
+	if req.TenantID != nil {
+		dataSource.TenantID = *req.TenantID
+		fields = append(fields, "TenantID")
+	}
+	if req.PartialResponse != nil {
+		dataSource.PartialResponse = *req.PartialResponse
+		fields = append(fields, "PartialResponse")
+	}
+	if req.MemberIDs != nil {
+		if dataSource.Flavor != model.DSFlavorVirtual {
+			return nil, fmt.Errorf("%w: only virtual data sources have members", ErrInvalidPrometheusDataSource)
+		}
+		sources, err := s.members(ctx, userID, id, *req.MemberIDs)
+		if err != nil {
+			return nil, err
+		}
+		dataSource.MemberIDs = dataSourceIDs(sources)
+		fields = append(fields, "MemberIDs")
+	}
+	switch {
+	case dataSource.Flavor == model.DSFlavorVirtual && len(dataSource.MemberIDs) == 0:
+		return nil, fmt.Errorf("%w: a virtual data source needs members", ErrInvalidPrometheusDataSource)
+	case dataSource.Flavor != model.DSFlavorVirtual && len(dataSource.MemberIDs) > 0:
+		dataSource.MemberIDs = nil
+		fields = append(fields, "MemberIDs")
+	}
+	if len(fields) == 0 {
+		return dataSource, nil
+	}
+
+	if err := s.dataSources.Update(ctx, dataSource, fields...); err != nil {
+		return nil, err
+	}
+	return dataSource, nil
+}
+
+// Delete removes one of the user's data sources
+func (s *DataSourceService) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	if _, err := s.Get(ctx, id, userID); err != nil {
+		return err
+	}
+	return s.dataSources.Delete(ctx, id)
+}
+
+// TestVirtual tests each of the members a virtual data source would have. It
+// succeeds when any member answers, as queries then do.
+func (s *DataSourceService) TestVirtual(ctx context.Context, userID uuid.UUID, memberIDs []uuid.UUID) *model.TestPrometheusDataSourceResponse {
+	started := time.Now()
+	result := &model.TestPrometheusDataSourceResponse{Flavor: model.DSFlavorVirtual}
+	defer func() { result.Duration = time.Since(started).Milliseconds() }()
+
+	members, err := s.members(ctx, userID, uuid.Nil, memberIDs)
+	if err != nil {
+		result.Message = "Invalid data source configuration"
+		result.Error = err.Error()
+		return result
+	}
+
+	results := make([]*model.TestPrometheusDataSourceResponse, len(members))
+	var wg sync.WaitGroup
+	for i, member := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = TestPrometheusConnection(ctx, member)
+		}()
+	}
+	wg.Wait()
+
+	result.Members = make(map[string]*model.TestPrometheusDataSourceResponse, len(members))
+	var failed []string
+	for i, member := range members {
+		result.Members[member.Name] = results[i]
+		if !results[i].Success {
+			failed = append(failed, member.Name)
+		}
+	}
+	result.Success = len(failed) < len(members)
+	switch {
+	case len(failed) == 0:
+		result.Message = fmt.Sprintf("All %d members answered", len(members))
+	case result.Success:
+		result.Message = fmt.Sprintf("%d of %d members answered; queries will return partial results", len(members)-len(failed), len(members))
+		result.Error = "failed: " + strings.Join(failed, ", ")
+	default:
+		result.Message = "No member answered"
+		result.Error = "failed: " + strings.Join(failed, ", ")
+	}
+	return result
+}
+
+// members validates the members of a virtual data source: at least one, each a
+// distinct physical data source of the user other than the virtual one itself
+func (s *DataSourceService) members(ctx context.Context, userID, self uuid.UUID, memberIDs []uuid.UUID) ([]*model.PrometheusDataSource, error) {
+	if len(memberIDs) == 0 {
+		return nil, fmt.Errorf("%w: a virtual data source needs members", ErrInvalidPrometheusDataSource)
+	}
+	seen := make(map[uuid.UUID]bool, len(memberIDs))
+	members := make([]*model.PrometheusDataSource, 0, len(memberIDs))
+	for _, memberID := range memberIDs {
+		if seen[memberID] {
+			continue
+		}
+		seen[memberID] = true
+		if memberID == self {
+			return nil, fmt.Errorf("%w: a virtual data source cannot be its own member", ErrInvalidPrometheusDataSource)
+		}
+		member, err := s.dataSources.FindOwned(ctx, memberID, userID)
+		if errors.Is(err, db.ErrNotFound) {
+			return nil, fmt.Errorf("%w: member %s not found", ErrInvalidPrometheusDataSource, memberID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if member.Flavor == model.DSFlavorVirtual {
+			return nil, fmt.Errorf("%w: member %s is itself virtual", ErrInvalidPrometheusDataSource, member.Name)
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// dataSourceIDs returns the IDs of data sources as stored in MemberIDs
+func dataSourceIDs(dataSources []*model.PrometheusDataSource) []string {
+	ids := make([]string, len(dataSources))
+	for i, dataSource := range dataSources {
+		ids[i] = dataSource.ID.String()
+	}
+	return ids
+}
+
+func (s *DataSourceService) checkName(ctx context.Context, userID uuid.UUID, name string, except uuid.UUID) error {
+	taken, err := s.dataSources.NameTaken(ctx, userID, name, except)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrPrometheusDataSourceExists
+	}
+	return nil
+}
+
+// dataSourceFlavor validates a backend flavor, defaulting to plain Prometheus
+func dataSourceFlavor(flavor string) (string, error) {
+	if !model.IsValidDataSourceFlavor(flavor) {
+		return "", fmt.Errorf("%w: flavor must be prometheus, thanos, victoriametrics, mimir or virtual", ErrInvalidPrometheusDataSource)
+	}
+	if flavor == "" {
+		return model.DSFlavorPrometheus, nil
+	}
+	return flavor, nil
+}
+
+// ownCluster checks that the optional cluster belongs to userID
+func ownCluster(ctx context.Context, clusters ClusterRepository, clusterID *uuid.UUID, userID uuid.UUID) error {
+	if clusterID == nil {
+		return nil
+	}
+	_, err := clusters.FindOwned(ctx, *clusterID, userID)
+	if errors.Is(err, db.ErrNotFound) {
+		return ErrClusterNotFound
+	}
+	return err
+}
+
+// PrometheusAlertRuleService manages the alerting rules pushed to Prometheus data sources
+type PrometheusAlertRuleService struct {
+	rules       PrometheusAlertRuleRepository
+	dataSources DataSourceRepository
+	clusters    ClusterRepository
+}
+
+// NewPrometheusAlertRuleService creates a new Prometheus alerting rule service
+func NewPrometheusAlertRuleService(rules PrometheusAlertRuleRepository, dataSources DataSourceRepository, clusters ClusterRepository) *PrometheusAlertRuleService {
+	return &PrometheusAlertRuleService{rules: rules, dataSources: dataSources, clusters: clusters}
+}
+
+// Create adds an enabled rule to one of the user's data sources
+func (s *PrometheusAlertRuleService) Create(ctx context.Context, userID uuid.UUID, req *model.CreatePrometheusAlertRuleRequest) (*model.PrometheusAlertRule, error) {
+	if _, err := s.dataSources.FindOwned(ctx, req.DataSourceID, userID); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return nil, ErrPrometheusDataSourceNotFound
+		}
+		return nil, err
+	}
+	if err := ownCluster(ctx, s.clusters, req.ClusterID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.checkName(ctx, req.DataSourceID, req.Name, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	rule := &model.PrometheusAlertRule{
+		UserID:       userID,
+		DataSourceID: req.DataSourceID,
+		ClusterID:    req.ClusterID,
+		Name:         req.Name,
+		Expression:   req.Expression,
+		Duration:     req.Duration,
+		Severity:     req.Severity,
+		Summary:      req.Summary,
+		Description:  req.Description,
+		Labels:       req.Labels,
+		Annotations:  req.Annotations,
+		Enabled:      true,
+	}
+	if err := s.rules.Create(ctx, rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// Get returns one of the user's rules with its data source and cluster
+func (s *PrometheusAlertRuleService) Get(ctx context.Context, id, userID uuid.UUID) (*model.PrometheusAlertRule, error) {
+	rule, err := s.rules.FindOwned(ctx, id, userID)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, ErrPrometheusAlertRuleNotFound
+	}
+	return rule, err
+}
+
+// List returns a page of the user's rules and how many match the filter
+func (s *PrometheusAlertRuleService) List(ctx context.Context, filter *db.PrometheusAlertRuleFilter) ([]model.PrometheusAlertRule, int64, error) {
+	return s.rules.List(ctx, filter)
+}
+
+// Update changes the fields set in req and marks the rule as needing a sync
+func (s *PrometheusAlertRuleService) Update(ctx context.Context, id, userID uuid.UUID, req *model.UpdatePrometheusAlertRuleRequest) (*model.PrometheusAlertRule, error) {
+	rule, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []string{"Synced"}
+	if req.Name != nil && *req.Name != rule.Name {
+		if err := s.checkName(ctx, rule.DataSourceID, *req.Name, id); err != nil {
+			return nil, err
+		}
+		rule.Name = *req.Name
+		fields = append(fields, "Name")
+	}
+	if req.Expression != nil {
+		rule.Expression = *req.Expression
+		fields = append(fields, "Expression")
+	}
+	if req.Duration != nil {
+		rule.Duration = *req.Duration
+		fields = append(fields, "Duration")
+	}
+	if req.Severity != nil {
+		rule.Severity = *req.Severity
+		fields = append(fields, "Severity")
+	}
+	if req.Summary != nil {
+		rule.Summary = *req.Summary
+		fields = append(fields, "Summary")
+	}
+	if req.Description != nil {
+		rule.Description = *req.Description
+		fields = append(fields, "Description")
+	}
+	if req.Labels != nil {
+		rule.Labels = *req.Labels
+		fields = append(fields, "Labels")
+	}
+	if req.Annotations != nil {
+		rule.Annotations = *req.Annotations
+		fields = append(fields, "Annotations")
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+		fields = append(fields, "Enabled")
+	}
+	rule.Synced = false
+
+	if err := s.rules.Update(ctx, rule, fields...); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// Delete removes one of the user's rules
+func (s *PrometheusAlertRuleService) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	if _, err := s.Get(ctx, id, userID); err != nil {
+		return err
+	}
+	return s.rules.Delete(ctx, id)
+}
+
+func (s *PrometheusAlertRuleService) checkName(ctx context.Context, dataSourceID uuid.UUID, name string, except uuid.UUID) error {
+	taken, err := s.rules.NameTaken(ctx, dataSourceID, name, except)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrPrometheusAlertRuleExists
+	}
+	return nil
+}
@@ -0,0 +1,792 @@
+// Package service provides deployment pipelines: CI posts an image tag to a
+// pipeline's signed webhook, the tag is rolled out to a deployment or Helm
+// release, and how the rollout went is reported back to CI
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// pipelineDefaultTimeout is the seconds a rollout has to become healthy by default
+	pipelineDefaultTimeout = 600
+	// pipelineMinTimeout and pipelineMaxTimeout bound the rollout timeout of a pipeline
+	pipelineMinTimeout = 60
+	pipelineMaxTimeout = 3600
+	// pipelinePollInterval is how often a rollout is checked while it is waited for
+	pipelinePollInterval = 5 * time.Second
+	// pipelineActionTimeout bounds changing and restoring a deployment or release
+	pipelineActionTimeout = 30 * time.Second
+	// pipelineCallbackTimeout bounds a callback to CI
+	pipelineCallbackTimeout = 10 * time.Second
+	// pipelineSignatureTolerance bounds the age of signed webhook requests, against replays
+	pipelineSignatureTolerance = 5 * time.Minute
+	// pipelineDefaultValuesKey is the values key Helm pipelines set the tag at by default
+	pipelineDefaultValuesKey = "image.tag"
+)
+
+var (
+	// pipelineTag matches image tags and digests
+	pipelineTag = regexp.MustCompile(`^([A-Za-z0-9_][A-Za-z0-9_.-]{0,127}|sha256:[0-9a-f]{64})$`)
+	// pipelineValuesKey matches dotted values keys
+	pipelineValuesKey = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+	// deploymentName matches the names of deployments, DNS subdomains
+	deploymentName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]{0,251}[a-z0-9])?$`)
+)
+
+var (
+	// ErrPipelineNotFound is returned when the pipeline does not exist or the user may not view it
+	ErrPipelineNotFound = errors.New("deployment pipeline not found")
+	// ErrInvalidPipeline is returned for pipelines and runs whose configuration is malformed
+	ErrInvalidPipeline = errors.New("invalid deployment pipeline")
+	// ErrPipelineForbidden is returned when the user may view the pipeline but not act on it
+	ErrPipelineForbidden = errors.New("not allowed on this deployment pipeline")
+	// ErrPipelineUnauthorized is returned when a webhook request is not signed with the pipeline's secret
+	ErrPipelineUnauthorized = errors.New("invalid deployment pipeline signature")
+	// ErrPipelineDisabled is returned when a disabled pipeline is triggered
+	ErrPipelineDisabled = errors.New("deployment pipeline is disabled")
+	// ErrPipelineRunInProgress is returned when the pipeline is already rolling out a tag
+	ErrPipelineRunInProgress = errors.New("a run of this pipeline is already in progress")
+)
+
+// DeploymentPipelineService stores pipelines and runs them. Pipelines belong
+// to the user who created them; roles granting pipelines.view, pipelines.run
+// or pipelines.manage, bound to a pipeline or its cluster, share them.
+type DeploymentPipelineService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	releases *HelmReleaseService
+	events   *EventBus
+	http     *http.Client
+}
+
+// NewDeploymentPipelineService creates a new deployment pipeline service. Helm
+// pipelines upgrade their release through releases.
+func NewDeploymentPipelineService(db *gorm.DB, logger *zap.Logger, releases *HelmReleaseService) *DeploymentPipelineService {
+	return &DeploymentPipelineService{
+		db:       db,
+		logger:   logger,
+		releases: releases,
+		http:     &http.Client{Timeout: pipelineCallbackTimeout},
+	}
+}
+
+// SetEventBus sets the bus finished runs are published on
+func (s *DeploymentPipelineService) SetEventBus(events *EventBus) {
+	s.events = events
+}
+
+// ============== Pipelines ==============
+
+// Pipelines lists the pipelines the user may view by name, optionally those
+// of one cluster
+func (s *DeploymentPipelineService) Pipelines(userID uuid.UUID, clusterID *uuid.UUID) ([]model.DeploymentPipeline, error) {
+	query := s.db.Order("name")
+	if clusterID != nil {
+		query = query.Where("cluster_id = ?", *clusterID)
+	}
+	var all []model.DeploymentPipeline
+	if err := query.Find(&all).Error; err != nil {
+		return nil, err
+	}
+	pipelines := []model.DeploymentPipeline{}
+	for i := range all {
+		if s.allowed(userID, &all[i], "view") {
+			pipelines = append(pipelines, all[i])
+		}
+	}
+	return pipelines, nil
+}
+
+// Pipeline gets a pipeline the user may view
+func (s *DeploymentPipelineService) Pipeline(userID, id uuid.UUID) (*model.DeploymentPipeline, error) {
+	return s.find(userID, id, "view")
+}
+
+// Create adds a pipeline and returns it with its secret, which CI signs its
+// requests with. The user must own the cluster or be allowed to update
+// workloads in the pipeline's namespace.
+func (s *DeploymentPipelineService) Create(userID uuid.UUID, createdBy string, req *model.CreateDeploymentPipelineRequest) (*model.DeploymentPipelineSecret, error) {
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	pipeline := &model.DeploymentPipeline{
+		ID:                uuid.New(),
+		UserID:            userID,
+		Name:              strings.TrimSpace(req.Name),
+		Description:       req.Description,
+		ClusterID:         req.ClusterID,
+		Namespace:         strings.TrimSpace(req.Namespace),
+		TargetType:        req.TargetType,
+		Deployment:        strings.TrimSpace(req.Deployment),
+		Container:         strings.TrimSpace(req.Container),
+		ReleaseID:         req.ReleaseID,
+		ValuesKey:         strings.TrimSpace(req.ValuesKey),
+		ImageRepository:   strings.TrimSpace(req.ImageRepository),
+		TagPattern:        strings.TrimSpace(req.TagPattern),
+		RolloutTimeout:    req.RolloutTimeout,
+		RollbackOnFailure: req.RollbackOnFailure,
+		CallbackURL:       strings.TrimSpace(req.CallbackURL),
+		Secret:            req.Secret,
+		Enabled:           enabled,
+		CreatedBy:         createdBy,
+	}
+	if pipeline.Secret == "" {
+		secret, _, err := newSecretToken()
+		if err != nil {
+			return nil, err
+		}
+		pipeline.Secret = secret
+	} else if len(pipeline.Secret) < 16 {
+		return nil, fmt.Errorf("%w: secret must be at least 16 characters", ErrInvalidPipeline)
+	}
+	if err := s.validate(userID, pipeline); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(pipeline).Error; err != nil {
+		return nil, err
+	}
+	s.logger.Info("deployment pipeline created", zap.String("pipeline", pipeline.Name),
+		zap.String("clusterId", pipeline.ClusterID.String()), zap.String("target", pipelineTargetName(pipeline)))
+	return &model.DeploymentPipelineSecret{DeploymentPipeline: *pipeline, Secret: pipeline.Secret}, nil
+}
+
+// Update changes a pipeline. The user must be allowed to manage it and to
+// update workloads at its target.
+func (s *DeploymentPipelineService) Update(userID, id uuid.UUID, req *model.UpdateDeploymentPipelineRequest) (*model.DeploymentPipeline, error) {
+	pipeline, err := s.find(userID, id, "manage")
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		pipeline.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		pipeline.Description = *req.Description
+	}
+	if req.Namespace != nil {
+		pipeline.Namespace = strings.TrimSpace(*req.Namespace)
+	}
+	if req.Deployment != nil {
+		pipeline.Deployment = strings.TrimSpace(*req.Deployment)
+	}
+	if req.Container != nil {
+		pipeline.Container = strings.TrimSpace(*req.Container)
+	}
+	if req.ReleaseID != nil {
+		pipeline.ReleaseID = req.ReleaseID
+	}
+	if req.ValuesKey != nil {
+		pipeline.ValuesKey = strings.TrimSpace(*req.ValuesKey)
+	}
+	if req.ImageRepository != nil {
+		pipeline.ImageRepository = strings.TrimSpace(*req.ImageRepository)
+	}
+	if req.TagPattern != nil {
+		pipeline.TagPattern = strings.TrimSpace(*req.TagPattern)
+	}
+	if req.RolloutTimeout != nil {
+		pipeline.RolloutTimeout = *req.RolloutTimeout
+	}
+	if req.RollbackOnFailure != nil {
+		pipeline.RollbackOnFailure = *req.RollbackOnFailure
+	}
+	if req.CallbackURL != nil {
+		pipeline.CallbackURL = strings.TrimSpace(*req.CallbackURL)
+	}
+	if req.Enabled != nil {
+		pipeline.Enabled = *req.Enabled
+	}
+	if err := s.validate(userID, pipeline); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Model(pipeline).Select("Name", "Description", "Namespace", "Deployment", "Container", "ReleaseID",
+		"ValuesKey", "ImageRepository", "TagPattern", "RolloutTimeout", "RollbackOnFailure", "CallbackURL", "Enabled").
+		Updates(pipeline).Error
+	if err != nil {
+		return nil, err
+	}
+	return pipeline, nil
+}
+
+// RotateSecret replaces the secret of a pipeline the user may manage. CI must
+// sign its requests with the new secret from then on.
+func (s *DeploymentPipelineService) RotateSecret(userID, id uuid.UUID) (*model.DeploymentPipelineSecret, error) {
+	pipeline, err := s.find(userID, id, "manage")
+	if err != nil {
+		return nil, err
+	}
+	secret, _, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(pipeline).Update("secret", secret).Error; err != nil {
+		return nil, err
+	}
+	pipeline.Secret = secret
+	return &model.DeploymentPipelineSecret{DeploymentPipeline: *pipeline, Secret: secret}, nil
+}
+
+// Delete removes a pipeline the user may manage and its runs. What it rolled
+// out stays in the cluster.
+func (s *DeploymentPipelineService) Delete(userID, id uuid.UUID) error {
+	pipeline, err := s.find(userID, id, "manage")
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("pipeline_id = ?", pipeline.ID).Delete(&model.DeploymentPipelineRun{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(pipeline).Error
+	})
+}
+
+// validate checks a pipeline and that the user may update workloads at its
+// target. Helm pipelines take the namespace of their release, which must
+// belong to the pipeline's owner, whom upgrades are made as.
+func (s *DeploymentPipelineService) validate(userID uuid.UUID, pipeline *model.DeploymentPipeline) error {
+	if pipeline.Name == "" || len(pipeline.Name) > 100 {
+		return fmt.Errorf("%w: name is required and must be at most 100 characters", ErrInvalidPipeline)
+	}
+	switch pipeline.TargetType {
+	case model.PipelineTargetDeployment:
+		if !deploymentName.MatchString(pipeline.Deployment) {
+			return fmt.Errorf("%w: deployment must be a valid Kubernetes name", ErrInvalidPipeline)
+		}
+		if pipeline.Container != "" && !kubernetesName.MatchString(pipeline.Container) {
+			return fmt.Errorf("%w: container must be a valid Kubernetes name", ErrInvalidPipeline)
+		}
+		if strings.ContainsAny(pipeline.ImageRepository, " @") {
+			return fmt.Errorf("%w: imageRepository must be an image without a tag or digest", ErrInvalidPipeline)
+		}
+		pipeline.ReleaseID = nil
+		pipeline.ValuesKey = ""
+	case model.PipelineTargetHelm:
+		if pipeline.ReleaseID == nil {
+			return fmt.Errorf("%w: releaseId is required", ErrInvalidPipeline)
+		}
+		release, err := s.releases.release(pipeline.UserID, *pipeline.ReleaseID)
+		if err != nil {
+			return err
+		}
+		if release.ClusterID != pipeline.ClusterID {
+			return fmt.Errorf("%w: the release is in another cluster", ErrInvalidPipeline)
+		}
+		if pipeline.ValuesKey == "" {
+			pipeline.ValuesKey = pipelineDefaultValuesKey
+		}
+		if !pipelineValuesKey.MatchString(pipeline.ValuesKey) {
+			return fmt.Errorf("%w: valuesKey must be a dotted values key such as image.tag", ErrInvalidPipeline)
+		}
+		pipeline.Namespace = release.Namespace
+		pipeline.Deployment = ""
+		pipeline.Container = ""
+		pipeline.ImageRepository = ""
+	default:
+		return fmt.Errorf("%w: targetType must be deployment or helm", ErrInvalidPipeline)
+	}
+	if !kubernetesName.MatchString(pipeline.Namespace) {
+		return fmt.Errorf("%w: namespace must be a valid Kubernetes name", ErrInvalidPipeline)
+	}
+	if pipeline.TagPattern != "" {
+		if _, err := regexp.Compile(pipeline.TagPattern); err != nil {
+			return fmt.Errorf("%w: tagPattern: %v", ErrInvalidPipeline, err)
+		}
+	}
+	if pipeline.RolloutTimeout == 0 {
+		pipeline.RolloutTimeout = pipelineDefaultTimeout
+	}
+	if pipeline.RolloutTimeout < pipelineMinTimeout || pipeline.RolloutTimeout > pipelineMaxTimeout {
+		return fmt.Errorf("%w: rolloutTimeout must be between %d and %d seconds", ErrInvalidPipeline, pipelineMinTimeout, pipelineMaxTimeout)
+	}
+	if pipeline.CallbackURL != "" {
+		parsed, err := url.Parse(pipeline.CallbackURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%w: callbackUrl must be an http or https URL", ErrInvalidPipeline)
+		}
+	}
+
+	var cluster model.K8sCluster
+	if err := s.db.Where("id = ?", pipeline.ClusterID).First(&cluster).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrClusterNotFound
+		}
+		return err
+	}
+	if cluster.UserID != userID && !model.UserHasNamespacePermission(s.db, userID, "workloads", "update", cluster.ID, pipeline.Namespace).Allowed {
+		return fmt.Errorf("%w: permission workloads.update required in namespace %s", ErrPipelineForbidden, pipeline.Namespace)
+	}
+	return nil
+}
+
+// find loads a pipeline the user may act on. Pipelines the user may not view
+// are not found.
+func (s *DeploymentPipelineService) find(userID, id uuid.UUID, action string) (*model.DeploymentPipeline, error) {
+	var pipeline model.DeploymentPipeline
+	if err := s.db.Where("id = ?", id).First(&pipeline).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPipelineNotFound
+		}
+		return nil, err
+	}
+	if !s.allowed(userID, &pipeline, action) {
+		if action != "view" && s.allowed(userID, &pipeline, "view") {
+			return nil, fmt.Errorf("%w: permission pipelines.%s required", ErrPipelineForbidden, action)
+		}
+		return nil, ErrPipelineNotFound
+	}
+	return &pipeline, nil
+}
+
+// allowed reports whether the user owns the pipeline or holds the pipelines
+// permission for action on it
+func (s *DeploymentPipelineService) allowed(userID uuid.UUID, pipeline *model.DeploymentPipeline, action string) bool {
+	if pipeline.UserID == userID {
+		return true
+	}
+	return model.CheckPermission(s.db, userID, "pipelines", action, model.PermissionTarget{
+		ResourceID:   &pipeline.ID,
+		ResourceType: "pipeline",
+		ClusterID:    &pipeline.ClusterID,
+		Namespace:    pipeline.Namespace,
+	}).Allowed
+}
+
+// ============== Runs ==============
+
+// Runs lists a pipeline's runs, newest first
+func (s *DeploymentPipelineService) Runs(userID, id uuid.UUID, limit int) ([]model.DeploymentPipelineRun, error) {
+	if _, err := s.find(userID, id, "view"); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	runs := []model.DeploymentPipelineRun{}
+	err := s.db.Where("pipeline_id = ?", id).Order("started_at DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// Trigger rolls out a tag on behalf of a user allowed to run the pipeline
+// and returns the run while it is in progress
+func (s *DeploymentPipelineService) Trigger(userID uuid.UUID, triggeredBy string, id uuid.UUID, req *model.TriggerDeploymentPipelineRequest) (*model.DeploymentPipelineRun, error) {
+	pipeline, err := s.find(userID, id, "run")
+	if err != nil {
+		return nil, err
+	}
+	return s.start(pipeline, model.PipelineTriggerManual, triggeredBy, req)
+}
+
+// HandleInbound rolls out the tag CI posted to a pipeline's webhook. The body
+// must be signed with the pipeline's secret like outbound webhook deliveries:
+// X-Webhook-Signature is sha256= and the hex HMAC-SHA256 of the
+// X-Webhook-Timestamp, a dot and the body.
+func (s *DeploymentPipelineService) HandleInbound(id uuid.UUID, header http.Header, body []byte) (*model.DeploymentPipelineRun, error) {
+	var pipeline model.DeploymentPipeline
+	if err := s.db.Where("id = ?", id).First(&pipeline).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPipelineNotFound
+		}
+		return nil, err
+	}
+	if !verifyPipelineSignature(pipeline.Secret, header, body, time.Now()) {
+		return nil, ErrPipelineUnauthorized
+	}
+	var req model.TriggerDeploymentPipelineRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("%w: invalid request body", ErrInvalidPipeline)
+	}
+	return s.start(&pipeline, model.PipelineTriggerWebhook, "webhook", &req)
+}
+
+// verifyPipelineSignature checks that a request was signed with the secret
+// within pipelineSignatureTolerance of now
+func verifyPipelineSignature(secret string, header http.Header, body []byte, now time.Time) bool {
+	timestamp := header.Get(WebhookHeaderTimestamp)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > pipelineSignatureTolerance || age < -pipelineSignatureTolerance {
+		return false
+	}
+	expected := "sha256=" + SignWebhookPayload(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(header.Get(WebhookHeaderSignature)))
+}
+
+// start checks the tag, records a running run unless the pipeline already has
+// one and rolls the tag out in the background
+func (s *DeploymentPipelineService) start(pipeline *model.DeploymentPipeline, trigger model.PipelineRunTrigger, triggeredBy string, req *model.TriggerDeploymentPipelineRequest) (*model.DeploymentPipelineRun, error) {
+	if !pipeline.Enabled {
+		return nil, ErrPipelineDisabled
+	}
+	tag := strings.TrimSpace(req.Tag)
+	if !pipelineTag.MatchString(tag) {
+		return nil, fmt.Errorf("%w: tag must be an image tag or sha256 digest", ErrInvalidPipeline)
+	}
+	if pipeline.TagPattern != "" {
+		if pattern, err := regexp.Compile(pipeline.TagPattern); err != nil || !pattern.MatchString(tag) {
+			return nil, fmt.Errorf("%w: tag %s does not match the pipeline's tag pattern", ErrInvalidPipeline, tag)
+		}
+	}
+	run := &model.DeploymentPipelineRun{
+		ID:          uuid.New(),
+		PipelineID:  pipeline.ID,
+		Trigger:     trigger,
+		Tag:         tag,
+		Commit:      strings.TrimSpace(req.Commit),
+		Ref:         strings.TrimSpace(req.Ref),
+		Status:      model.PipelineRunRunning,
+		Rollouts:    []model.PipelineRollout{},
+		TriggeredBy: triggeredBy,
+		StartedAt:   time.Now(),
+	}
+	if len(run.Commit) > 64 || len(run.Ref) > 255 {
+		return nil, fmt.Errorf("%w: commit must be at most 64 and ref at most 255 characters", ErrInvalidPipeline)
+	}
+	if buildURL := strings.TrimSpace(req.BuildURL); buildURL != "" {
+		parsed, err := url.Parse(buildURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(buildURL) > 2048 {
+			return nil, fmt.Errorf("%w: buildUrl must be an http or https URL", ErrInvalidPipeline)
+		}
+		run.BuildURL = buildURL
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var running int64
+		if err := tx.Model(&model.DeploymentPipelineRun{}).
+			Where("pipeline_id = ? AND status = ?", pipeline.ID, model.PipelineRunRunning).
+			Count(&running).Error; err != nil {
+			return err
+		}
+		if running > 0 {
+			return ErrPipelineRunInProgress
+		}
+		return tx.Create(run).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("deployment pipeline run started", zap.String("pipeline", pipeline.Name),
+		zap.String("tag", tag), zap.String("trigger", string(trigger)))
+	go s.execute(pipeline, run)
+	return run, nil
+}
+
+// execute rolls the run's tag out, waits for the rollout to become healthy,
+// restores what it replaced if it does not and the pipeline rolls back, and
+// reports to CI when it starts and ends
+func (s *DeploymentPipelineService) execute(pipeline *model.DeploymentPipeline, run *model.DeploymentPipelineRun) {
+	s.report(pipeline, run)
+
+	rolledBack := false
+	client, err := s.clusterClient(pipeline.ClusterID)
+	if err == nil {
+		defer client.Close()
+		var selector string
+		if selector, err = s.deploy(client, pipeline, run); err == nil {
+			err = s.wait(client, pipeline, run, selector)
+			if err != nil && pipeline.RollbackOnFailure && run.Previous != "" {
+				if restoreErr := s.restore(client, pipeline, run); restoreErr != nil {
+					err = fmt.Errorf("%v; rollback failed: %v", err, restoreErr)
+				} else {
+					rolledBack = true
+				}
+			}
+		}
+	}
+
+	now := time.Now()
+	run.FinishedAt = &now
+	switch {
+	case err == nil:
+		run.Status = model.PipelineRunSucceeded
+	case rolledBack:
+		run.Status = model.PipelineRunRolledBack
+		run.Message = err.Error() + "; restored " + run.Previous
+	default:
+		run.Status = model.PipelineRunFailed
+		run.Message = err.Error()
+	}
+	if err := s.db.Save(run).Error; err != nil {
+		s.logger.Error("failed to record deployment pipeline run", zap.String("runId", run.ID.String()), zap.Error(err))
+	}
+	if err := s.db.Model(pipeline).Updates(map[string]interface{}{
+		"last_tag":    run.Tag,
+		"last_status": run.Status,
+		"last_run_at": now,
+	}).Error; err != nil {
+		s.logger.Error("failed to record deployment pipeline status", zap.String("pipelineId", pipeline.ID.String()), zap.Error(err))
+	}
+	if run.Status == model.PipelineRunSucceeded {
+		s.logger.Info("deployment pipeline run succeeded", zap.String("pipeline", pipeline.Name), zap.String("tag", run.Tag))
+	} else {
+		s.logger.Warn("deployment pipeline run failed", zap.String("pipeline", pipeline.Name), zap.String("tag", run.Tag),
+			zap.String("message", run.Message))
+	}
+
+	s.report(pipeline, run)
+	s.events.Publish(pipeline.UserID, model.EventPipelineRunFinished, map[string]string{
+		"pipelineId": pipeline.ID.String(),
+		"clusterId":  pipeline.ClusterID.String(),
+		"trigger":    string(run.Trigger),
+		"status":     string(run.Status),
+	}, run)
+}
+
+// deploy sets the run's tag on the pipeline's deployment or release and
+// records what it replaced. It returns the label selector of the deployments
+// of a release to wait for.
+func (s *DeploymentPipelineService) deploy(client *k8s.ClusterClient, pipeline *model.DeploymentPipeline, run *model.DeploymentPipelineRun) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pipelineActionTimeout)
+	defer cancel()
+
+	if pipeline.TargetType == model.PipelineTargetHelm {
+		release, err := s.releases.release(pipeline.UserID, *pipeline.ReleaseID)
+		if err != nil {
+			return "", err
+		}
+		values, err := parseHelmValues(release.Values)
+		if err != nil {
+			return "", fmt.Errorf("release values: %w", err)
+		}
+		if previous := lookupHelmValue(values, pipeline.ValuesKey); previous != nil {
+			run.Previous = fmt.Sprint(previous)
+		}
+		setHelmValue(values, pipeline.ValuesKey, run.Tag)
+		_, err = s.releases.Upgrade(ctx, pipeline.UserID, pipelineChangedBy(pipeline), release.ID, &model.UpdateHelmReleaseRequest{
+			Values: helmToYAML(values) + "\n",
+		})
+		if err != nil {
+			return "", err
+		}
+		return appInstanceLabel + "=" + release.Name, nil
+	}
+
+	container, current, err := client.DeploymentImage(ctx, pipeline.Namespace, pipeline.Deployment, pipeline.Container)
+	if err != nil {
+		return "", err
+	}
+	repository := pipeline.ImageRepository
+	if repository == "" {
+		repository = imageRepository(current)
+	}
+	run.Previous = current
+	run.Image = pipelineImage(repository, run.Tag)
+	if err := client.SetDeploymentImage(ctx, pipeline.Namespace, pipeline.Deployment, container, run.Image); err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+// wait polls the rollout until it is done, fails or exceeds the pipeline's
+// rollout timeout, recording its progress on the run
+func (s *DeploymentPipelineService) wait(client *k8s.ClusterClient, pipeline *model.DeploymentPipeline, run *model.DeploymentPipelineRun, selector string) error {
+	timeout := time.Duration(pipeline.RolloutTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ticker := time.NewTicker(pipelinePollInterval)
+	defer ticker.Stop()
+
+	for {
+		var rollouts []k8s.DeploymentRollout
+		var err error
+		if pipeline.TargetType == model.PipelineTargetHelm {
+			rollouts, err = client.DeploymentRolloutStatuses(ctx, pipeline.Namespace, selector)
+		} else {
+			var rollout *k8s.DeploymentRollout
+			if rollout, err = client.DeploymentRolloutStatus(ctx, pipeline.Namespace, pipeline.Deployment); err == nil {
+				rollouts = []k8s.DeploymentRollout{*rollout}
+			}
+		}
+		if err == nil {
+			done := true
+			run.Rollouts = make([]model.PipelineRollout, 0, len(rollouts))
+			for _, rollout := range rollouts {
+				if rollout.Failed {
+					return fmt.Errorf("deployment %s failed to roll out: %s", rollout.Name, rollout.Message)
+				}
+				done = done && rollout.Done
+				run.Rollouts = append(run.Rollouts, model.PipelineRollout{
+					Name:      rollout.Name,
+					Replicas:  rollout.Replicas,
+					Updated:   rollout.Updated,
+					Available: rollout.Available,
+					Done:      rollout.Done,
+					Message:   rollout.Message,
+				})
+			}
+			if done {
+				return nil
+			}
+			s.db.Model(run).Select("Rollouts").Updates(run)
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("rollout did not become healthy within %s: %w", timeout, err)
+			}
+			return fmt.Errorf("rollout did not become healthy within %s", timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// restore puts back the image or release revision the run replaced
+func (s *DeploymentPipelineService) restore(client *k8s.ClusterClient, pipeline *model.DeploymentPipeline, run *model.DeploymentPipelineRun) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pipelineActionTimeout)
+	defer cancel()
+
+	if pipeline.TargetType == model.PipelineTargetHelm {
+		_, err := s.releases.Rollback(pipeline.UserID, pipelineChangedBy(pipeline), *pipeline.ReleaseID, &model.RollbackHelmReleaseRequest{})
+		return err
+	}
+	container, _, err := client.DeploymentImage(ctx, pipeline.Namespace, pipeline.Deployment, pipeline.Container)
+	if err != nil {
+		return err
+	}
+	return client.SetDeploymentImage(ctx, pipeline.Namespace, pipeline.Deployment, container, run.Previous)
+}
+
+// report posts the run to the pipeline's callback URL, signed with its secret
+// like outbound webhook deliveries. Callbacks are not retried; the outcome of
+// the last one is recorded on the run.
+func (s *DeploymentPipelineService) report(pipeline *model.DeploymentPipeline, run *model.DeploymentPipelineRun) {
+	if pipeline.CallbackURL == "" {
+		return
+	}
+	payload, err := json.Marshal(model.PipelineCallback{
+		PipelineID: pipeline.ID,
+		Pipeline:   pipeline.Name,
+		RunID:      run.ID,
+		Status:     run.Status,
+		Tag:        run.Tag,
+		Image:      run.Image,
+		Commit:     run.Commit,
+		Ref:        run.Ref,
+		BuildURL:   run.BuildURL,
+		Message:    run.Message,
+		Rollouts:   run.Rollouts,
+		StartedAt:  run.StartedAt,
+		FinishedAt: run.FinishedAt,
+	})
+	if err != nil {
+		s.logger.Error("failed to encode deployment pipeline callback", zap.String("runId", run.ID.String()), zap.Error(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pipelineCallbackTimeout)
+	defer cancel()
+	run.CallbackStatus, run.CallbackError = 0, ""
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pipeline.CallbackURL, bytes.NewReader(payload))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "myops-pipelines/1.0")
+		req.Header.Set(WebhookHeaderDelivery, run.ID.String())
+		req.Header.Set(WebhookHeaderTimestamp, timestamp)
+		req.Header.Set(WebhookHeaderSignature, "sha256="+SignWebhookPayload(pipeline.Secret, timestamp, payload))
+		var resp *http.Response
+		if resp, err = s.http.Do(req); err == nil {
+			resp.Body.Close()
+			run.CallbackStatus = resp.StatusCode
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				run.CallbackError = fmt.Sprintf("callback responded with status %d", resp.StatusCode)
+			}
+		}
+	}
+	if err != nil {
+		run.CallbackError = err.Error()
+	}
+	if run.CallbackError != "" {
+		s.logger.Warn("deployment pipeline callback failed", zap.String("pipeline", pipeline.Name), zap.String("error", run.CallbackError))
+	}
+	if err := s.db.Model(run).Select("CallbackStatus", "CallbackError").Updates(run).Error; err != nil {
+		s.logger.Error("failed to record deployment pipeline callback", zap.String("runId", run.ID.String()), zap.Error(err))
+	}
+}
+
+// Recover marks runs that have been running longer than any run may take as
+// failed, as those of a gateway that stopped during them
+func (s *DeploymentPipelineService) Recover() error {
+	cutoff := time.Now().Add(-pipelineMaxTimeout*time.Second - 2*pipelineActionTimeout - 2*pipelineCallbackTimeout)
+	return s.db.Model(&model.DeploymentPipelineRun{}).
+		Where("status = ? AND started_at < ?", model.PipelineRunRunning, cutoff).
+		Updates(map[string]interface{}{
+			"status":      model.PipelineRunFailed,
+			"message":     "run was interrupted",
+			"finished_at": time.Now(),
+		}).Error
+}
+
+func (s *DeploymentPipelineService) clusterClient(clusterID uuid.UUID) (*k8s.ClusterClient, error) {
+	var cluster model.K8sCluster
+	if err := s.db.Where("id = ?", clusterID).First(&cluster).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrClusterNotFound
+		}
+		return nil, err
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+	return client, nil
+}
+
+// pipelineTargetName names what a pipeline rolls out to, for logs
+func pipelineTargetName(pipeline *model.DeploymentPipeline) string {
+	if pipeline.TargetType == model.PipelineTargetHelm {
+		return "release/" + pipeline.ReleaseID.String()
+	}
+	return "deployment/" + pipeline.Namespace + "/" + pipeline.Deployment
+}
+
+// pipelineChangedBy is who Helm revisions made by a pipeline are recorded as
+func pipelineChangedBy(pipeline *model.DeploymentPipeline) string {
+	return "pipeline:" + pipeline.Name
+}
+
+// imageRepository returns an image without its tag or digest
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// pipelineImage returns the image of a repository at a tag or digest
+func pipelineImage(repository, tag string) string {
+	if strings.HasPrefix(tag, "sha256:") {
+		return repository + "@" + tag
+	}
+	return repository + ":" + tag
+}
@@ -0,0 +1,326 @@
+// Package service provides the diagnostics bundle administrators download for
+// support: the gateway's build, configuration, recent errors and the state of
+// its schema, job queue, inventory and dependencies
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// Files of a diagnostics bundle
+const (
+	diagnosticsManifestFile   = "manifest.json"
+	diagnosticsVersionFile    = "version.json"
+	diagnosticsConfigFile     = "config.yaml"
+	diagnosticsErrorsFile     = "errors.jsonl"
+	diagnosticsMigrationsFile = "migrations.json"
+	diagnosticsJobsFile       = "jobs.json"
+	diagnosticsInventoryFile  = "inventory.json"
+	diagnosticsHealthFile     = "health.json"
+	diagnosticsLatencyFile    = "latency.json"
+)
+
+// Secrets scrubbed from every file of a bundle, on top of the redaction of the
+// configuration: values of secret-looking keys, bearer tokens and passwords in
+// URLs
+var diagnosticsSecrets = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)((?:password|passwd|secret|token|api[_-]?key|private[_-]?key)"?\s*[:=]\s*"?)[^\s"&,;]+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(?i)(bearer\s+)[a-z0-9\-._~+/]+=*`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(://[^/\s:@"]*:)[^/\s@"]+@`), "${1}xxxxx@"},
+}
+
+// DiagnosticsOptions is what a diagnostics bundle is assembled from. Sources
+// left nil are reported as missing from the bundle.
+type DiagnosticsOptions struct {
+	Config        interface{} // Gateway configuration, its secrets already redacted
+	MigrationsDir string
+	Health        *HealthService
+	Jobs          *JobQueue
+	Commands      *AgentCommandService
+	ErrorLog      *ErrorLog
+	Latency       *RouteLatencyService
+}
+
+// DiagnosticsService assembles diagnostics bundles
+type DiagnosticsService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	opts   DiagnosticsOptions
+}
+
+// NewDiagnosticsService creates a new diagnostics service
+func NewDiagnosticsService(db *gorm.DB, logger *zap.Logger, opts DiagnosticsOptions) *DiagnosticsService {
+	return &DiagnosticsService{db: db, logger: logger, opts: opts}
+}
+
+// DiagnosticsBundle is a collected bundle, ready to be written as a tar.gz
+type DiagnosticsBundle struct {
+	Manifest model.DiagnosticsManifest
+	files    map[string][]byte
+}
+
+// Collect gathers every section of a bundle. A section that cannot be
+// collected is left out and its error recorded in the manifest, so a bundle is
+// produced however broken the gateway is.
+func (s *DiagnosticsService) Collect(ctx context.Context, userID uuid.UUID, requestID string) *DiagnosticsBundle {
+	hostname, _ := os.Hostname()
+	bundle := &DiagnosticsBundle{
+		Manifest: model.DiagnosticsManifest{
+			CreatedAt: time.Now().UTC(),
+			CreatedBy: userID,
+			Hostname:  hostname,
+			RequestID: requestID,
+		},
+		files: make(map[string][]byte),
+	}
+
+	sections := []struct {
+		file    string
+		collect func(ctx context.Context) ([]byte, error)
+	}{
+		{diagnosticsVersionFile, func(context.Context) ([]byte, error) { return diagnosticsJSON(buildVersion()) }},
+		{diagnosticsConfigFile, s.config},
+		{diagnosticsErrorsFile, s.errorLog},
+		{diagnosticsMigrationsFile, s.migrations},
+		{diagnosticsJobsFile, s.jobs},
+		{diagnosticsInventoryFile, s.inventory},
+		{diagnosticsHealthFile, s.health},
+		{diagnosticsLatencyFile, s.latency},
+	}
+	for _, section := range sections {
+		data, err := section.collect(ctx)
+		if err != nil {
+			if bundle.Manifest.Errors == nil {
+				bundle.Manifest.Errors = make(map[string]string)
+			}
+			bundle.Manifest.Errors[section.file] = scrubSecrets(err.Error())
+			continue
+		}
+		bundle.Manifest.Files = append(bundle.Manifest.Files, section.file)
+		bundle.files[section.file] = []byte(scrubSecrets(string(data)))
+	}
+
+	s.logger.Info("diagnostics bundle collected",
+		zap.String("user_id", userID.String()),
+		zap.Strings("files", bundle.Manifest.Files),
+		zap.Int("missing", len(bundle.Manifest.Errors)))
+	return bundle
+}
+
+// Write writes the bundle as a gzipped tar archive, the manifest first
+func (b *DiagnosticsBundle) Write(w io.Writer) error {
+	manifest, err := diagnosticsJSON(b.Manifest)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeTarFile(tw, diagnosticsManifestFile, manifest, b.Manifest.CreatedAt); err != nil {
+		return err
+	}
+	for _, name := range b.Manifest.Files {
+		if err := writeTarFile(tw, name, b.files[name], b.Manifest.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func (s *DiagnosticsService) config(context.Context) ([]byte, error) {
+	if s.opts.Config == nil {
+		return nil, errors.New("configuration is not available")
+	}
+	return yaml.Marshal(s.opts.Config)
+}
+
+// errorLog lists the recent errors as JSON lines, oldest first
+func (s *DiagnosticsService) errorLog(context.Context) ([]byte, error) {
+	if s.opts.ErrorLog == nil {
+		return nil, errors.New("error log is not available")
+	}
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	for _, entry := range s.opts.ErrorLog.Entries() {
+		if err := enc.Encode(entry); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+func (s *DiagnosticsService) migrations(ctx context.Context) ([]byte, error) {
+	status, err := migrationStatus(ctx, s.db, s.opts.MigrationsDir)
+	if err != nil {
+		return nil, err
+	}
+	return diagnosticsJSON(status)
+}
+
+func (s *DiagnosticsService) jobs(context.Context) ([]byte, error) {
+	if s.opts.Jobs == nil {
+		return nil, errors.New("job queue is not configured")
+	}
+	stats, err := s.opts.Jobs.Stats()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job queue: %w", err)
+	}
+	return diagnosticsJSON(stats)
+}
+
+func (s *DiagnosticsService) inventory(ctx context.Context) ([]byte, error) {
+	if s.db == nil {
+		return nil, errors.New("database is not configured")
+	}
+	db := s.db.WithContext(ctx)
+	inventory := model.DiagnosticsInventory{
+		HostsByStatus:    make(map[string]int64),
+		ClustersByStatus: make(map[string]int64),
+	}
+
+	var counts []struct {
+		Status string
+		Count  int64
+	}
+	if err := db.Model(&model.Host{}).Select("status, COUNT(*) AS count").
+		Group("status").Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("failed to count hosts: %w", err)
+	}
+	for _, c := range counts {
+		inventory.HostsByStatus[c.Status] = c.Count
+	}
+	if err := db.Model(&model.Host{}).Where("last_seen_at > ?", time.Now().Add(-AgentOnlineWindow)).
+		Count(&inventory.AgentsReporting).Error; err != nil {
+		return nil, fmt.Errorf("failed to count agents: %w", err)
+	}
+	if s.opts.Commands != nil {
+		inventory.AgentChannels = s.opts.Commands.ConnectedHosts()
+	}
+
+	counts = nil
+	if err := db.Model(&model.K8sCluster{}).Select("status, COUNT(*) AS count").
+		Group("status").Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("failed to count clusters: %w", err)
+	}
+	for _, c := range counts {
+		inventory.ClustersByStatus[c.Status] = c.Count
+	}
+	return diagnosticsJSON(inventory)
+}
+
+func (s *DiagnosticsService) health(ctx context.Context) ([]byte, error) {
+	if s.opts.Health == nil {
+		return nil, errors.New("health service is not configured")
+	}
+	return diagnosticsJSON(s.opts.Health.Ready(ctx))
+}
+
+func (s *DiagnosticsService) latency(context.Context) ([]byte, error) {
+	if s.opts.Latency == nil {
+		return nil, errors.New("latency tracking is not configured")
+	}
+	return diagnosticsJSON(s.opts.Latency.Report())
+}
+
+// migrationStatus reads the schema version recorded by golang-migrate and
+// lists the migrations in dir it has not reached
+func migrationStatus(ctx context.Context, db *gorm.DB, dir string) (*model.MigrationStatus, error) {
+	if db == nil {
+		return nil, errors.New("database is not configured")
+	}
+
+	var status model.MigrationStatus
+	row := db.WithContext(ctx).Raw("SELECT version, dirty FROM schema_migrations LIMIT 1").Row()
+	if err := row.Scan(&status.AppliedVersion, &status.Dirty); err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		name := filepath.Base(file)
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		if version > status.LatestVersion {
+			status.LatestVersion = version
+		}
+		if version > status.AppliedVersion {
+			status.Pending = append(status.Pending, strings.TrimSuffix(name, ".up.sql"))
+		}
+	}
+	return &status, nil
+}
+
+// buildVersion reads the gateway's version from the build information the Go
+// toolchain embeds
+func buildVersion() model.DiagnosticsVersion {
+	version := model.DiagnosticsVersion{
+		Version:   "unknown",
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version
+	}
+	version.Module = info.Main.Path
+	if info.Main.Version != "" {
+		version.Version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			version.Revision = setting.Value
+		case "vcs.time":
+			version.BuiltAt = setting.Value
+		case "vcs.modified":
+			version.Modified = setting.Value == "true"
+		}
+	}
+	return version
+}
+
+func diagnosticsJSON(v interface{}) ([]byte, error) {
+	return json.MarshalIndent(v, "", "  ")
+}
+
+// scrubSecrets replaces what looks like a secret in text
+func scrubSecrets(text string) string {
+	for _, secret := range diagnosticsSecrets {
+		text = secret.pattern.ReplaceAllString(text, secret.replacement)
+	}
+	return text
+}
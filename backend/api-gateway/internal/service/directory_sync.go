@@ -0,0 +1,285 @@
+// Package service provides scheduled LDAP directory sync with dry-run reports
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	ldapauth "github.com/wangjialin/myops/pkg/auth/ldap"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ErrDirectoryNotConfigured is returned when syncing without LDAP configured
+var ErrDirectoryNotConfigured = errors.New("LDAP is not configured")
+
+// ErrDirectorySyncRunning is returned when a sync is requested while one runs
+var ErrDirectorySyncRunning = errors.New("a directory sync is already running")
+
+// DirectorySyncService syncs LDAP users into local accounts: it provisions users
+// found in the directory, updates their details, deactivates users that left and
+// keeps their roles in step with their groups. A dry run reports the same changes
+// without making them.
+type DirectorySyncService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	settings *SettingsService
+	sso      *SSOService
+
+	running sync.Mutex
+	mu      sync.RWMutex
+	last    *model.DirectorySyncReport
+}
+
+// NewDirectorySyncService creates a new directory sync service
+func NewDirectorySyncService(db *gorm.DB, logger *zap.Logger, settings *SettingsService, sso *SSOService) *DirectorySyncService {
+	return &DirectorySyncService{
+		db:       db,
+		logger:   logger,
+		settings: settings,
+		sso:      sso,
+	}
+}
+
+// Run syncs on the directory_sync.interval schedule while directory_sync.enabled is
+// set, until ctx is cancelled
+func (s *DirectorySyncService) Run(ctx context.Context) {
+	for {
+		interval := s.settings.Duration(model.SettingDirectorySyncInterval)
+		if interval <= 0 {
+			interval = time.Hour
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if !s.settings.Bool(model.SettingDirectorySyncEnabled) {
+			continue
+		}
+		report, err := s.SyncLDAP(ctx, false)
+		if err != nil {
+			s.logger.Error("directory sync failed", zap.Error(err))
+			continue
+		}
+		s.logger.Info("directory sync finished", zap.Int("scanned", report.Scanned), zap.Any("summary", report.Summary))
+	}
+}
+
+// LastReport returns the report of the last sync that was applied, or nil
+func (s *DirectorySyncService) LastReport() *model.DirectorySyncReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.last
+}
+
+// ldapDirectoryUser is a user as read from the directory
+type ldapDirectoryUser struct {
+	username    string
+	email       string
+	displayName string
+	groups      []string
+}
+
+// SyncLDAP syncs LDAP users. With dryRun set nothing is changed and the report lists
+// what would be.
+func (s *DirectorySyncService) SyncLDAP(ctx context.Context, dryRun bool) (*model.DirectorySyncReport, error) {
+	client := s.sso.LDAPClient()
+	if client == nil {
+		return nil, ErrDirectoryNotConfigured
+	}
+	if !s.running.TryLock() {
+		return nil, ErrDirectorySyncRunning
+	}
+	defer s.running.Unlock()
+
+	report := &model.DirectorySyncReport{
+		Source:    model.UserTypeLDAP,
+		DryRun:    dryRun,
+		StartedAt: time.Now(),
+		Summary:   make(map[string]int),
+		Changes:   []model.DirectorySyncChange{},
+	}
+	err := s.syncLDAP(ctx, client, report)
+	report.FinishedAt = time.Now()
+	if err != nil {
+		report.Error = err.Error()
+	}
+	if !dryRun {
+		s.mu.Lock()
+		s.last = report
+		s.mu.Unlock()
+	}
+	return report, err
+}
+
+func (s *DirectorySyncService) syncLDAP(ctx context.Context, client *ldapauth.Client, report *model.DirectorySyncReport) error {
+	entries, err := client.SearchUsers(s.settings.String(model.SettingDirectorySyncLDAPFilter))
+	if err != nil {
+		return err
+	}
+
+	groupAttribute := s.sso.LDAPGroupAttribute()
+	directory := make(map[string]ldapDirectoryUser, len(entries))
+	for _, entry := range entries {
+		// Attributes are read the same way LDAP login reads them
+		user := ldapDirectoryUser{
+			username:    ldapauth.GetUserAttribute(entry, "uid"),
+			email:       ldapauth.GetUserAttribute(entry, "mail"),
+			displayName: ldapauth.GetUserAttribute(entry, "cn"),
+		}
+		if user.username == "" {
+			continue
+		}
+		if user.email == "" {
+			user.email = user.username + "@ldap.local"
+		}
+		if groupAttribute != "" {
+			user.groups = ldapauth.GetUserAttributeValues(entry, groupAttribute)
+		}
+		directory[user.username] = user
+	}
+	report.Scanned = len(directory)
+
+	var locals []model.User
+	if err := s.db.Find(&locals).Error; err != nil {
+		return err
+	}
+	byUsername := make(map[string]*model.User, len(locals))
+	byEmail := make(map[string]*model.User, len(locals))
+	for i := range locals {
+		byUsername[locals[i].Username] = &locals[i]
+		byEmail[strings.ToLower(locals[i].Email)] = &locals[i]
+	}
+
+	usernames := make([]string, 0, len(directory))
+	for username := range directory {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	for _, username := range usernames {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.syncLDAPUser(directory[username], byUsername, byEmail, report); err != nil {
+			return fmt.Errorf("failed to sync %s: %w", username, err)
+		}
+	}
+
+	if !s.settings.Bool(model.SettingDirectorySyncDeprovision) {
+		return nil
+	}
+	// An empty result is far more likely a wrong filter or base DN than everyone
+	// leaving, so nobody is deactivated on it
+	if len(directory) == 0 {
+		return fmt.Errorf("directory returned no users; nobody was deactivated")
+	}
+	for i := range locals {
+		user := &locals[i]
+		if user.UserType != model.UserTypeLDAP || !user.IsActive {
+			continue
+		}
+		if _, ok := directory[user.Username]; ok {
+			continue
+		}
+		report.Add(model.DirectorySyncChange{Action: model.DirectoryChangeDeactivate, Username: user.Username, UserID: &user.ID,
+			Detail: "not found in the directory"})
+		if !report.DryRun {
+			if err := s.db.Model(user).Update("is_active", false).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncLDAPUser provisions or updates one directory user and syncs their roles
+func (s *DirectorySyncService) syncLDAPUser(entry ldapDirectoryUser, byUsername, byEmail map[string]*model.User, report *model.DirectorySyncReport) error {
+	user := byUsername[entry.username]
+	if user != nil && user.UserType != model.UserTypeLDAP {
+		report.Add(model.DirectorySyncChange{Action: model.DirectoryChangeConflict, Username: entry.username, UserID: &user.ID,
+			Detail: "a " + user.UserType + " account with this username exists"})
+		return nil
+	}
+	if owner := byEmail[strings.ToLower(entry.email)]; owner != nil && owner != user {
+		report.Add(model.DirectorySyncChange{Action: model.DirectoryChangeConflict, Username: entry.username, UserID: &owner.ID,
+			Detail: "email " + entry.email + " belongs to " + owner.Username})
+		return nil
+	}
+
+	if user == nil {
+		user = &model.User{
+			ID:          uuid.New(),
+			Username:    entry.username,
+			Email:       entry.email,
+			UserType:    model.UserTypeLDAP,
+			DisplayName: entry.displayName,
+			IsActive:    true,
+		}
+		report.Add(model.DirectorySyncChange{Action: model.DirectoryChangeCreate, Username: entry.username})
+		if !report.DryRun {
+			if err := s.db.Create(user).Error; err != nil {
+				return err
+			}
+		}
+		return s.syncRoles(user.ID, uuid.Nil, entry, report)
+	}
+
+	updates := make(map[string]interface{})
+	var changed []string
+	if user.Email != entry.email {
+		updates["email"] = entry.email
+		changed = append(changed, "email")
+	}
+	if entry.displayName != "" && user.DisplayName != entry.displayName {
+		updates["display_name"] = entry.displayName
+		changed = append(changed, "displayName")
+	}
+	if len(changed) > 0 {
+		report.Add(model.DirectorySyncChange{Action: model.DirectoryChangeUpdate, Username: entry.username, UserID: &user.ID,
+			Detail: strings.Join(changed, ", ")})
+	}
+	if !user.IsActive {
+		updates["is_active"] = true
+		report.Add(model.DirectorySyncChange{Action: model.DirectoryChangeReactivate, Username: entry.username, UserID: &user.ID})
+	}
+	if len(updates) > 0 && !report.DryRun {
+		if err := s.db.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return s.syncRoles(user.ID, user.ID, entry, report)
+}
+
+// syncRoles reports and, unless in a dry run, applies the role changes of a user.
+// planFor is uuid.Nil for users that do not exist yet.
+func (s *DirectorySyncService) syncRoles(userID, planFor uuid.UUID, entry ldapDirectoryUser, report *model.DirectorySyncReport) error {
+	grant, revoke, err := s.sso.PlanGroupRoles(planFor, entry.groups)
+	if err != nil {
+		return err
+	}
+	var id *uuid.UUID
+	if planFor != uuid.Nil {
+		id = &userID
+	}
+	for _, role := range grant {
+		report.Add(model.DirectorySyncChange{Action: model.DirectoryChangeGrantRole, Username: entry.username, UserID: id, Detail: role.Name})
+	}
+	for _, role := range revoke {
+		report.Add(model.DirectorySyncChange{Action: model.DirectoryChangeRevokeRole, Username: entry.username, UserID: id, Detail: role.Name})
+	}
+	if report.DryRun || len(grant)+len(revoke) == 0 {
+		return nil
+	}
+	return s.sso.SyncGroupRoles(userID, entry.groups)
+}
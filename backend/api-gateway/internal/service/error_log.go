@@ -0,0 +1,125 @@
+// Package service provides an in-memory log of the gateway's recent errors
+package service
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ErrorLogEntry is an error logged by the gateway
+type ErrorLogEntry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Logger  string                 `json:"logger,omitempty"`
+	Message string                 `json:"message"`
+	Caller  string                 `json:"caller,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+	Stack   string                 `json:"stack,omitempty"`
+}
+
+// ErrorLog keeps the last entries the gateway logged at error level or above,
+// for the diagnostics bundle
+type ErrorLog struct {
+	mu      sync.Mutex
+	entries []ErrorLogEntry
+	next    int
+	full    bool
+}
+
+// NewErrorLog creates an error log holding the last size entries
+func NewErrorLog(size int) *ErrorLog {
+	if size <= 0 {
+		size = 200
+	}
+	return &ErrorLog{entries: make([]ErrorLogEntry, size)}
+}
+
+// Tee returns a logger writing to logger and to the error log
+func (l *ErrorLog) Tee(logger *zap.Logger) *zap.Logger {
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, &errorLogCore{log: l})
+	}))
+}
+
+// Entries returns the entries held, oldest first
+func (l *ErrorLog) Entries() []ErrorLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.full {
+		return append([]ErrorLogEntry(nil), l.entries[:l.next]...)
+	}
+	entries := make([]ErrorLogEntry, 0, len(l.entries))
+	entries = append(entries, l.entries[l.next:]...)
+	return append(entries, l.entries[:l.next]...)
+}
+
+func (l *ErrorLog) add(entry ErrorLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = entry
+	l.next++
+	if l.next == len(l.entries) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// errorLogCore is the zap core feeding an error log, with the fields of the
+// logger it was derived for
+type errorLogCore struct {
+	log    *ErrorLog
+	fields []zapcore.Field
+}
+
+func (c *errorLogCore) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.ErrorLevel
+}
+
+func (c *errorLogCore) With(fields []zapcore.Field) zapcore.Core {
+	return &errorLogCore{
+		log:    c.log,
+		fields: append(append([]zapcore.Field(nil), c.fields...), fields...),
+	}
+}
+
+func (c *errorLogCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *errorLogCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range c.fields {
+		field.AddTo(enc)
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+
+	logged := ErrorLogEntry{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Logger:  entry.LoggerName,
+		Message: entry.Message,
+		Stack:   entry.Stack,
+	}
+	if entry.Caller.Defined {
+		logged.Caller = entry.Caller.TrimmedPath()
+	}
+	if len(enc.Fields) > 0 {
+		logged.Fields = enc.Fields
+	}
+	c.log.add(logged)
+	return nil
+}
+
+func (c *errorLogCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,145 @@
+// Package service provides the in-process event bus for platform events
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+)
+
+// EventHandler receives every event published on the bus, together with the user
+// who owns the resource the event is about
+type EventHandler func(userID uuid.UUID, event *model.PlatformEvent)
+
+// EventBus fans platform events out to handlers and per-user subscriptions
+type EventBus struct {
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	handlers []EventHandler
+	subs     map[*EventSubscription]struct{}
+}
+
+// NewEventBus creates a new event bus
+func NewEventBus(logger *zap.Logger) *EventBus {
+	return &EventBus{
+		logger: logger,
+		subs:   make(map[*EventSubscription]struct{}),
+	}
+}
+
+// Handle registers a handler that is called synchronously for every event. Handlers
+// must not block; slow work belongs in a goroutine.
+func (b *EventBus) Handle(handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish sends an event to all handlers and to the subscriptions of userID.
+// Publishing on a nil bus is a no-op so publishers need not check for one.
+func (b *EventBus) Publish(userID uuid.UUID, eventType model.EventType, attrs map[string]string, data interface{}) {
+	if b == nil {
+		return
+	}
+
+	event := &model.PlatformEvent{
+		ID:         uuid.New(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Attributes: attrs,
+		Data:       data,
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handler := range b.handlers {
+		handler(userID, event)
+	}
+	for sub := range b.subs {
+		if sub.userID == userID {
+			sub.offer(event)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events of userID. Events are dropped, and
+// counted, when the subscriber falls more than buffer events behind.
+func (b *EventBus) Subscribe(userID uuid.UUID, buffer int) *EventSubscription {
+	sub := &EventSubscription{
+		bus:    b,
+		userID: userID,
+		events: make(chan *model.PlatformEvent, buffer),
+	}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// MatchEventFilters reports whether every filtered attribute has one of its allowed
+// values in attrs
+func MatchEventFilters(filters map[string][]string, attrs map[string]string) bool {
+	for attr, allowed := range filters {
+		value, ok := attrs[attr]
+		if !ok || !containsString(allowed, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// EventSubscription is a buffered stream of one user's events
+type EventSubscription struct {
+	bus    *EventBus
+	userID uuid.UUID
+	events chan *model.PlatformEvent
+
+	mu      sync.Mutex
+	dropped int
+	closed  bool
+}
+
+// Events returns the channel events are delivered on. It is closed by Close.
+func (s *EventSubscription) Events() <-chan *model.PlatformEvent {
+	return s.events
+}
+
+// Dropped returns and resets the number of events dropped since the last call
+func (s *EventSubscription) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.dropped
+	s.dropped = 0
+	return n
+}
+
+// Close removes the subscription from the bus
+func (s *EventSubscription) Close() {
+	s.bus.mu.Lock()
+	delete(s.bus.subs, s)
+	s.bus.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+}
+
+func (s *EventSubscription) offer(event *model.PlatformEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+		s.dropped++
+	}
+}
@@ -0,0 +1,525 @@
+// Package service provides cross-signal correlation of metrics, logs and traces
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// Correlation limits
+const (
+	defaultCorrelationRange  = time.Hour
+	maxCorrelationRange      = 7 * 24 * time.Hour
+	minCorrelationStep       = 15 * time.Second
+	targetCorrelationPoints  = 240
+	maxCorrelationPoints     = 11000 // Prometheus rejects range queries above 11,000 points
+	defaultCorrelationTraces = 20
+)
+
+var (
+	// ErrInvalidCorrelation is returned when a correlation request is malformed
+	ErrInvalidCorrelation = errors.New("invalid correlation request")
+	// ErrCorrelationResourceNotFound is returned when the resource to correlate does not exist
+	ErrCorrelationResourceNotFound = errors.New("resource not found")
+)
+
+// CorrelationService gathers the metrics, logs and traces of a resource onto one time axis
+type CorrelationService struct {
+	db     *gorm.DB
+	traces *TraceService
+}
+
+// NewCorrelationService creates a new correlation service
+func NewCorrelationService(db *gorm.DB) *CorrelationService {
+	return &CorrelationService{db: db, traces: NewTraceService(db)}
+}
+
+// metricQuery is a named PromQL expression
+type metricQuery struct {
+	name  string
+	query string
+}
+
+// resourceSignals describes how to select one resource in each backend
+type resourceSignals struct {
+	resource    model.CorrelatedResource
+	matchers    string // PromQL label matchers, without braces
+	metrics     []metricQuery
+	logSelector string
+	traceQuery  model.TraceSearchQuery
+}
+
+// Correlate fetches metrics, logs and traces for the requested resource concurrently.
+// Backend failures are reported per section; only an invalid request or missing
+// resource fails the whole call.
+func (s *CorrelationService) Correlate(ctx context.Context, userID uuid.UUID, req *model.CorrelationRequest) (*model.CorrelationResult, error) {
+	step, err := normalizeCorrelationRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	signals, err := s.resolveResource(userID, req, step)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.CorrelationResult{
+		Resource: signals.resource,
+		Start:    req.Start,
+		End:      req.End,
+		Step:     step.String(),
+		Metrics:  model.CorrelatedMetrics{Series: []model.MetricSeries{}},
+		Logs:     model.CorrelatedLogs{Entries: []model.LogEntry{}},
+		Traces:   model.CorrelatedTraces{Traces: []model.TraceSummary{}},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		s.collectMetrics(ctx, userID, req, signals, step, &result.Metrics)
+	}()
+	go func() {
+		defer wg.Done()
+		s.collectLogs(ctx, userID, req, signals, &result.Logs)
+	}()
+	go func() {
+		defer wg.Done()
+		s.collectTraces(ctx, userID, req, signals, &result.Traces)
+	}()
+	wg.Wait()
+
+	result.Timeline = buildTimeline(req.Start, req.End, step, result.Logs.Entries, result.Traces.Traces)
+	return result, nil
+}
+
+// normalizeCorrelationRequest validates the request, fills in defaults and returns the step.
+// Times are converted to UTC and the start is aligned to the step so that metric samples,
+// log buckets and trace buckets share the same grid.
+func normalizeCorrelationRequest(req *model.CorrelationRequest) (time.Duration, error) {
+	if !req.ResourceType.IsValid() {
+		return 0, fmt.Errorf("%w: resourceType must be pod, host or service", ErrInvalidCorrelation)
+	}
+	if req.End.IsZero() {
+		req.End = time.Now()
+	}
+	if req.Start.IsZero() {
+		req.Start = req.End.Add(-defaultCorrelationRange)
+	}
+	if !req.Start.Before(req.End) {
+		return 0, fmt.Errorf("%w: start must be before end", ErrInvalidCorrelation)
+	}
+	if req.End.Sub(req.Start) > maxCorrelationRange {
+		return 0, fmt.Errorf("%w: time range must not exceed %s", ErrInvalidCorrelation, maxCorrelationRange)
+	}
+
+	var step time.Duration
+	if req.Step != "" {
+		d, err := time.ParseDuration(req.Step)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("%w: invalid step", ErrInvalidCorrelation)
+		}
+		step = d.Truncate(time.Second)
+		if step < time.Second {
+			step = time.Second
+		}
+	} else {
+		step = (req.End.Sub(req.Start) / targetCorrelationPoints).Truncate(time.Second)
+		if step < minCorrelationStep {
+			step = minCorrelationStep
+		}
+	}
+	if int(req.End.Sub(req.Start)/step) > maxCorrelationPoints {
+		return 0, fmt.Errorf("%w: step is too small for the time range", ErrInvalidCorrelation)
+	}
+
+	req.Start = req.Start.UTC().Truncate(step)
+	req.End = req.End.UTC()
+
+	if req.LogLimit <= 0 {
+		req.LogLimit = DefaultLogQueryLimit
+	}
+	if req.LogLimit > MaxLogQueryLimit {
+		req.LogLimit = MaxLogQueryLimit
+	}
+	if req.TraceLimit <= 0 {
+		req.TraceLimit = defaultCorrelationTraces
+	}
+	if req.TraceLimit > MaxTraceSearchLimit {
+		req.TraceLimit = MaxTraceSearchLimit
+	}
+	return step, nil
+}
+
+// resolveResource looks up the resource and builds its selectors for each backend
+func (s *CorrelationService) resolveResource(userID uuid.UUID, req *model.CorrelationRequest, step time.Duration) (*resourceSignals, error) {
+	if req.ClusterID != nil {
+		var cluster model.K8sCluster
+		if err := s.db.Where("id = ? AND user_id = ?", *req.ClusterID, userID).First(&cluster).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, fmt.Errorf("%w: cluster", ErrCorrelationResourceNotFound)
+			}
+			return nil, err
+		}
+	}
+
+	// Rate windows cover several steps so sparse scrapes still produce a value
+	window := promDuration(max(4*step, time.Minute))
+
+	switch req.ResourceType {
+	case model.CorrelationResourcePod:
+		if req.ClusterID == nil || req.Namespace == "" || req.Name == "" {
+			return nil, fmt.Errorf("%w: clusterId, namespace and name are required for pods", ErrInvalidCorrelation)
+		}
+		matchers := fmt.Sprintf(`namespace=%s,pod=%s`, strconv.Quote(req.Namespace), strconv.Quote(req.Name))
+		return &resourceSignals{
+			resource: model.CorrelatedResource{
+				Type:      req.ResourceType,
+				Name:      req.Name,
+				Namespace: req.Namespace,
+				ClusterID: req.ClusterID,
+				Labels:    map[string]string{"namespace": req.Namespace, "pod": req.Name},
+			},
+			matchers: matchers,
+			metrics: []metricQuery{
+				{"cpu_cores", fmt.Sprintf(`sum by (pod) (rate(container_cpu_usage_seconds_total{%s,container!=""}[%s]))`, matchers, window)},
+				{"memory_working_set_bytes", fmt.Sprintf(`sum by (pod) (container_memory_working_set_bytes{%s,container!=""})`, matchers)},
+				{"restarts", fmt.Sprintf(`sum by (pod) (kube_pod_container_status_restarts_total{%s})`, matchers)},
+			},
+			logSelector: "{" + matchers + "}",
+			traceQuery: model.TraceSearchQuery{
+				Tags: map[string]string{"k8s.namespace.name": req.Namespace, "k8s.pod.name": req.Name},
+			},
+		}, nil
+
+	case model.CorrelationResourceHost:
+		var host model.Host
+		query := s.db.Model(&model.Host{})
+		switch {
+		case req.HostID != nil:
+			query = query.Where("id = ?", *req.HostID)
+		case req.Name != "":
+			query = query.Where("hostname = ?", req.Name)
+		default:
+			return nil, fmt.Errorf("%w: hostId or name is required for hosts", ErrInvalidCorrelation)
+		}
+		if err := query.First(&host).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, fmt.Errorf("%w: host", ErrCorrelationResourceNotFound)
+			}
+			return nil, err
+		}
+
+		// node_exporter targets are addressed by IP, with or without the port
+		ip := strings.Split(host.IPAddress, "/")[0]
+		matchers := fmt.Sprintf(`instance=~%s`, strconv.Quote(regexp.QuoteMeta(ip)+`(:[0-9]+)?`))
+		return &resourceSignals{
+			resource: model.CorrelatedResource{
+				Type:   req.ResourceType,
+				Name:   host.Hostname,
+				HostID: &host.ID,
+				Labels: map[string]string{"host": host.Hostname, "instance": ip},
+			},
+			matchers: matchers,
+			metrics: []metricQuery{
+				{"cpu_usage_percent", fmt.Sprintf(`100 * (1 - avg(rate(node_cpu_seconds_total{%s,mode="idle"}[%s])))`, matchers, window)},
+				{"memory_usage_percent", fmt.Sprintf(`100 * (1 - sum(node_memory_MemAvailable_bytes{%[1]s}) / sum(node_memory_MemTotal_bytes{%[1]s}))`, matchers)},
+				{"load1", fmt.Sprintf(`max(node_load1{%s})`, matchers)},
+			},
+			logSelector: fmt.Sprintf(`{host=%s}`, strconv.Quote(host.Hostname)),
+			traceQuery: model.TraceSearchQuery{
+				Tags: map[string]string{"host.name": host.Hostname},
+			},
+		}, nil
+
+	default: // service
+		if req.Name == "" {
+			return nil, fmt.Errorf("%w: name is required for services", ErrInvalidCorrelation)
+		}
+		labels := map[string]string{"service": req.Name}
+		matchers := fmt.Sprintf(`service_name=%s`, strconv.Quote(req.Name))
+		logSelector := fmt.Sprintf(`{service_name=%s}`, strconv.Quote(req.Name))
+		if req.Namespace != "" {
+			labels["namespace"] = req.Namespace
+			logSelector = fmt.Sprintf(`{service_name=%s,namespace=%s}`, strconv.Quote(req.Name), strconv.Quote(req.Namespace))
+		}
+		return &resourceSignals{
+			resource: model.CorrelatedResource{
+				Type:      req.ResourceType,
+				Name:      req.Name,
+				Namespace: req.Namespace,
+				ClusterID: req.ClusterID,
+				Labels:    labels,
+			},
+			matchers: matchers,
+			// Span metrics generated by Tempo or the OpenTelemetry spanmetrics connector
+			metrics: []metricQuery{
+				{"request_rate", fmt.Sprintf(`sum(rate(traces_spanmetrics_calls_total{%s,span_kind="SPAN_KIND_SERVER"}[%s]))`, matchers, window)},
+				{"error_rate", fmt.Sprintf(`sum(rate(traces_spanmetrics_calls_total{%s,span_kind="SPAN_KIND_SERVER",status_code="STATUS_CODE_ERROR"}[%s]))`, matchers, window)},
+				{"latency_p95_seconds", fmt.Sprintf(`histogram_quantile(0.95, sum by (le) (rate(traces_spanmetrics_latency_bucket{%s,span_kind="SPAN_KIND_SERVER"}[%s])))`, matchers, window)},
+			},
+			logSelector: logSelector,
+			traceQuery:  model.TraceSearchQuery{Service: req.Name},
+		}, nil
+	}
+}
+
+// collectMetrics runs the resource's metric queries plus any requested by the caller
+func (s *CorrelationService) collectMetrics(ctx context.Context, userID uuid.UUID, req *model.CorrelationRequest, signals *resourceSignals, step time.Duration, out *model.CorrelatedMetrics) {
+	var ds model.PrometheusDataSource
+	if err := s.dataSource(&ds, userID, req.PrometheusDataSourceID, req.ClusterID); err != nil {
+		out.Error = dataSourceError("prometheus", err)
+		return
+	}
+	out.DataSourceID = &ds.ID
+
+	client, err := NewDataSourceQuerier(s.db, &ds)
+	if err != nil {
+		out.Error = err.Error()
+		return
+	}
+
+	queries := signals.metrics
+	for i, expr := range req.Metrics {
+		queries = append(queries, metricQuery{
+			name:  fmt.Sprintf("custom_%d", i+1),
+			query: strings.ReplaceAll(expr, "$labels", signals.matchers),
+		})
+	}
+
+	var failures []string
+	for _, q := range queries {
+		series, _, err := client.QueryRange(ctx, q.query, req.Start, req.End, step)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", q.name, err))
+			continue
+		}
+		for _, ps := range series {
+			out.Series = append(out.Series, toMetricSeries(q, ps))
+		}
+	}
+	out.Error = strings.Join(failures, "; ")
+}
+
+// toMetricSeries converts a Prometheus series, dropping samples JSON cannot represent
+func toMetricSeries(q metricQuery, ps model.PrometheusSeries) model.MetricSeries {
+	labels := make(map[string]string, len(ps.Metric))
+	for k, v := range ps.Metric {
+		if k != "__name__" {
+			labels[k] = v
+		}
+	}
+
+	points := make([]model.MetricPoint, 0, len(ps.Values))
+	for _, v := range ps.Values {
+		value, err := strconv.ParseFloat(v.Value, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		sec, frac := math.Modf(v.Timestamp)
+		points = append(points, model.MetricPoint{
+			Timestamp: time.Unix(int64(sec), int64(frac*1e9)).UTC(),
+			Value:     value,
+		})
+	}
+	return model.MetricSeries{Name: q.name, Query: q.query, Labels: labels, Points: points}
+}
+
+// collectLogs queries the log backend, falling back to the Kubernetes API for pods
+// when no log data source is configured
+func (s *CorrelationService) collectLogs(ctx context.Context, userID uuid.UUID, req *model.CorrelationRequest, signals *resourceSignals, out *model.CorrelatedLogs) {
+	query := signals.logSelector
+	if filter := strings.TrimSpace(req.LogQuery); filter != "" {
+		if strings.HasPrefix(filter, "|") {
+			query += " " + filter
+		} else {
+			query += " |= " + strconv.Quote(filter)
+		}
+	}
+
+	var ds model.LogDataSource
+	err := s.dataSource(&ds, userID, req.LogDataSourceID, req.ClusterID)
+	if err == gorm.ErrRecordNotFound && req.LogDataSourceID == nil && req.ResourceType == model.CorrelationResourcePod {
+		out.Source = "kubernetes"
+		entries, err := s.podLogs(ctx, req)
+		if err != nil {
+			out.Error = err.Error()
+			return
+		}
+		out.Entries = entries
+		out.Truncated = len(entries) >= req.LogLimit
+		return
+	}
+	if err != nil {
+		out.Error = dataSourceError("log", err)
+		return
+	}
+	out.DataSourceID = &ds.ID
+	out.Source = string(ds.Type)
+	out.Query = query
+
+	backend, err := NewLogBackend(&ds)
+	if err != nil {
+		out.Error = err.Error()
+		return
+	}
+	entries, err := backend.Query(ctx, query, req.Start, req.End, req.LogLimit)
+	if err != nil {
+		out.Error = err.Error()
+		return
+	}
+	if entries != nil {
+		out.Entries = entries
+	}
+	out.Truncated = len(entries) >= req.LogLimit
+}
+
+// podLogs reads a pod's logs for the window straight from the cluster
+func (s *CorrelationService) podLogs(ctx context.Context, req *model.CorrelationRequest) ([]model.LogEntry, error) {
+	var cluster model.K8sCluster
+	if err := s.db.First(&cluster, "id = ?", *req.ClusterID).Error; err != nil {
+		return nil, fmt.Errorf("cluster not found")
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := client.GetPodLogsSince(ctx, req.Namespace, req.Name, req.Start, int64(MaxLogQueryLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{"namespace": req.Namespace, "pod": req.Name}
+	entries := []model.LogEntry{}
+	scanner := bufio.NewScanner(strings.NewReader(raw))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		stamp, line, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339Nano, stamp)
+		if err != nil || ts.After(req.End) {
+			continue
+		}
+		entries = append(entries, model.LogEntry{
+			Timestamp: ts.UTC(),
+			Line:      line,
+			Level:     LogLevel(line, nil),
+			Labels:    labels,
+		})
+	}
+
+	// Match the log backend: newest first, capped at the limit
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp.After(entries[j].Timestamp) })
+	if len(entries) > req.LogLimit {
+		entries = entries[:req.LogLimit]
+	}
+	return entries, nil
+}
+
+// collectTraces searches the trace backend for traces touching the resource
+func (s *CorrelationService) collectTraces(ctx context.Context, userID uuid.UUID, req *model.CorrelationRequest, signals *resourceSignals, out *model.CorrelatedTraces) {
+	var ds model.TraceDataSource
+	if err := s.dataSource(&ds, userID, req.TraceDataSourceID, req.ClusterID); err != nil {
+		out.Error = dataSourceError("trace", err)
+		return
+	}
+	out.DataSourceID = &ds.ID
+
+	query := signals.traceQuery
+	query.Start = req.Start
+	query.End = req.End
+	query.Limit = req.TraceLimit
+
+	traces, err := s.traces.Search(ctx, &ds, query)
+	if err != nil {
+		out.Error = err.Error()
+		return
+	}
+	for i := range traces {
+		traces[i].StartTime = traces[i].StartTime.UTC()
+	}
+	if traces != nil {
+		out.Traces = traces
+	}
+}
+
+// dataSource loads the requested data source, or the user's active one preferring
+// the data source linked to the cluster
+func (s *CorrelationService) dataSource(out interface{}, userID uuid.UUID, id, clusterID *uuid.UUID) error {
+	query := s.db.Where("user_id = ? AND status = ?", userID, model.DSStatusActive)
+	if id != nil {
+		query = query.Where("id = ?", *id)
+	} else if clusterID != nil {
+		query = query.Order(gorm.Expr("COALESCE(cluster_id = ?, false) DESC", *clusterID))
+	}
+	return query.Order("created_at").First(out).Error
+}
+
+// dataSourceError describes a failed data source lookup for a result section
+func dataSourceError(kind string, err error) string {
+	if err == gorm.ErrRecordNotFound {
+		return fmt.Sprintf("no active %s data source", kind)
+	}
+	return fmt.Sprintf("failed to load %s data source: %v", kind, err)
+}
+
+// buildTimeline counts logs and traces per step, on the same grid as the metric samples
+func buildTimeline(start, end time.Time, step time.Duration, logs []model.LogEntry, traces []model.TraceSummary) []model.CorrelationBucket {
+	n := int(end.Sub(start)/step) + 1
+	buckets := make([]model.CorrelationBucket, n)
+	for i := range buckets {
+		buckets[i].Timestamp = start.Add(time.Duration(i) * step)
+	}
+
+	index := func(ts time.Time) int {
+		if ts.Before(start) || ts.After(end) {
+			return -1
+		}
+		return int(ts.Sub(start) / step)
+	}
+	for _, entry := range logs {
+		if i := index(entry.Timestamp); i >= 0 {
+			buckets[i].LogCount++
+			if entry.Level == "error" || entry.Level == "fatal" {
+				buckets[i].ErrorLogCount++
+			}
+		}
+	}
+	for _, trace := range traces {
+		if i := index(trace.StartTime); i >= 0 {
+			buckets[i].TraceCount++
+			if trace.ErrorCount > 0 {
+				buckets[i].ErrorTraceCount++
+			}
+		}
+	}
+	return buckets
+}
+
+// promDuration formats a duration in PromQL syntax, e.g. 90s or 5m
+func promDuration(d time.Duration) string {
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	}
+	return fmt.Sprintf("%ds", int(d/time.Second))
+}
@@ -0,0 +1,348 @@
+// Package service provides feature flags with user, department and role targeting
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidFeatureFlag is returned for flag states that cannot be saved
+var ErrInvalidFeatureFlag = errors.New("invalid feature flag")
+
+// featureFlagKeyPattern restricts the keys of flags created through the API
+var featureFlagKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,127}$`)
+
+// flagSubjectTTL is how long a user's department and roles are cached for targeting
+const flagSubjectTTL = time.Minute
+
+// flagSubject is what flags can target a user by
+type flagSubject struct {
+	department string
+	roles      []string
+	loadedAt   time.Time
+}
+
+// FeatureFlagService evaluates feature flags for users. Flag states are cached and
+// reloaded periodically, so flips made on another gateway instance apply here too.
+type FeatureFlagService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	flags    map[string]model.FeatureFlag
+	subjects map[uuid.UUID]flagSubject
+}
+
+// NewFeatureFlagService creates a new feature flag service. Call Refresh to load the
+// stored flag states.
+func NewFeatureFlagService(db *gorm.DB, logger *zap.Logger) *FeatureFlagService {
+	return &FeatureFlagService{
+		db:       db,
+		logger:   logger,
+		flags:    make(map[string]model.FeatureFlag),
+		subjects: make(map[uuid.UUID]flagSubject),
+	}
+}
+
+// Run reloads the stored flag states every interval until ctx is cancelled
+func (s *FeatureFlagService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(); err != nil {
+				s.logger.Error("failed to refresh feature flags", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Refresh reloads the stored flag states and forgets cached user targeting
+func (s *FeatureFlagService) Refresh() error {
+	var flags []model.FeatureFlag
+	if err := s.db.Find(&flags).Error; err != nil {
+		return err
+	}
+
+	byKey := make(map[string]model.FeatureFlag, len(flags))
+	for _, flag := range flags {
+		byKey[flag.Key] = flag
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flags = byKey
+	s.subjects = make(map[uuid.UUID]flagSubject)
+	return nil
+}
+
+// ============== Evaluation ==============
+
+// IsEnabled reports whether the flag is on for the user. A nil service uses the
+// built-in defaults, so callers need not check for one.
+func (s *FeatureFlagService) IsEnabled(userID uuid.UUID, key string) bool {
+	if s == nil {
+		def, _ := model.LookupFeatureFlag(key)
+		return def.Default
+	}
+
+	s.mu.RLock()
+	flag, stored := s.flags[key]
+	s.mu.RUnlock()
+	if !stored {
+		def, _ := model.LookupFeatureFlag(key)
+		return def.Default
+	}
+	return s.evaluate(&flag, userID)
+}
+
+// Evaluate returns the state of every known flag for the user
+func (s *FeatureFlagService) Evaluate(userID uuid.UUID) map[string]bool {
+	states := make(map[string]bool, len(model.FeatureFlagDefinitions))
+	for _, def := range model.FeatureFlagDefinitions {
+		states[def.Key] = def.Default
+	}
+	if s == nil {
+		return states
+	}
+
+	s.mu.RLock()
+	flags := make([]model.FeatureFlag, 0, len(s.flags))
+	for _, flag := range s.flags {
+		flags = append(flags, flag)
+	}
+	s.mu.RUnlock()
+
+	for i := range flags {
+		states[flags[i].Key] = s.evaluate(&flags[i], userID)
+	}
+	return states
+}
+
+func (s *FeatureFlagService) evaluate(flag *model.FeatureFlag, userID uuid.UUID) bool {
+	if !flag.Enabled {
+		return false
+	}
+
+	targets := flag.Targets()
+	for _, id := range targets.Users {
+		if id == userID {
+			return true
+		}
+	}
+	if len(targets.Departments) > 0 || len(targets.Roles) > 0 {
+		subject := s.subject(userID)
+		if subject.department != "" && containsString(targets.Departments, subject.department) {
+			return true
+		}
+		for _, role := range subject.roles {
+			if containsString(targets.Roles, role) {
+				return true
+			}
+		}
+	}
+
+	return rolloutBucket(flag.Key, userID) < flag.RolloutPercent
+}
+
+// rolloutBucket places a user in one of 100 buckets, independently for each flag so
+// the same users are not always first to get new features
+func rolloutBucket(key string, userID uuid.UUID) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	h.Write(userID[:])
+	return int(h.Sum32() % 100)
+}
+
+// subject returns the user's department and global role names, cached briefly
+func (s *FeatureFlagService) subject(userID uuid.UUID) flagSubject {
+	s.mu.RLock()
+	subject, ok := s.subjects[userID]
+	s.mu.RUnlock()
+	if ok && time.Since(subject.loadedAt) < flagSubjectTTL {
+		return subject
+	}
+
+	subject = flagSubject{loadedAt: time.Now()}
+	var user model.User
+	if err := s.db.Select("department").Where("id = ?", userID).First(&user).Error; err == nil {
+		subject.department = user.Department
+	}
+	s.db.Table("user_roles").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id = ? AND user_roles.resource_id IS NULL", userID).
+		Where("user_roles.expires_at IS NULL OR user_roles.expires_at > ?", time.Now()).
+		Pluck("roles.name", &subject.roles)
+
+	s.mu.Lock()
+	s.subjects[userID] = subject
+	s.mu.Unlock()
+	return subject
+}
+
+// ============== Management ==============
+
+// List returns the built-in flags and every stored flag
+func (s *FeatureFlagService) List() []model.FeatureFlagResponse {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	responses := make([]model.FeatureFlagResponse, 0, len(model.FeatureFlagDefinitions)+len(s.flags))
+	for _, def := range model.FeatureFlagDefinitions {
+		responses = append(responses, s.responseLocked(def.Key))
+	}
+	for key := range s.flags {
+		if _, ok := model.LookupFeatureFlag(key); !ok {
+			responses = append(responses, s.responseLocked(key))
+		}
+	}
+	sort.Slice(responses, func(i, j int) bool {
+		return responses[i].Key < responses[j].Key
+	})
+	return responses
+}
+
+// Get returns one flag. It returns gorm.ErrRecordNotFound for unknown flags.
+func (s *FeatureFlagService) Get(key string) (*model.FeatureFlagResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, builtIn := model.LookupFeatureFlag(key)
+	if _, stored := s.flags[key]; !builtIn && !stored {
+		return nil, gorm.ErrRecordNotFound
+	}
+	resp := s.responseLocked(key)
+	return &resp, nil
+}
+
+// Set stores the state of a flag, creating custom flags as needed. The change
+// applies immediately on this instance.
+func (s *FeatureFlagService) Set(key string, req *model.UpdateFeatureFlagRequest, userID uuid.UUID) (*model.FeatureFlagResponse, error) {
+	if !featureFlagKeyPattern.MatchString(key) {
+		return nil, fmt.Errorf("%w: key must be lowercase letters, digits, '.', '_' or '-'", ErrInvalidFeatureFlag)
+	}
+	if req.RolloutPercent < 0 || req.RolloutPercent > 100 {
+		return nil, fmt.Errorf("%w: rolloutPercent must be between 0 and 100", ErrInvalidFeatureFlag)
+	}
+
+	users, _ := json.Marshal(nonNilUUIDs(req.Users))
+	departments, _ := json.Marshal(nonNilStrings(req.Departments))
+	roles, _ := json.Marshal(nonNilStrings(req.Roles))
+
+	flag := model.FeatureFlag{
+		Key:            key,
+		Enabled:        req.Enabled,
+		RolloutPercent: req.RolloutPercent,
+		Users:          string(users),
+		Departments:    string(departments),
+		Roles:          string(roles),
+		UpdatedBy:      &userID,
+	}
+	columns := []string{"enabled", "rollout_percent", "users", "departments", "roles", "updated_by", "updated_at"}
+	if req.Description != nil {
+		flag.Description = *req.Description
+		columns = append(columns, "description")
+	}
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(&flag).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("key = ?", key).First(&flag).Error; err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.flags[key] = flag
+	s.mu.Unlock()
+
+	s.logger.Info("feature flag changed",
+		zap.String("key", key),
+		zap.Bool("enabled", flag.Enabled),
+		zap.Int("rolloutPercent", flag.RolloutPercent),
+		zap.String("userId", userID.String()),
+	)
+	return s.Get(key)
+}
+
+// Delete removes a flag's stored state. Built-in flags return to their default;
+// custom flags are removed.
+func (s *FeatureFlagService) Delete(key string, userID uuid.UUID) error {
+	result := s.db.Where("key = ?", key).Delete(&model.FeatureFlag{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if _, builtIn := model.LookupFeatureFlag(key); !builtIn && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	s.mu.Lock()
+	delete(s.flags, key)
+	s.mu.Unlock()
+
+	s.logger.Info("feature flag reset", zap.String("key", key), zap.String("userId", userID.String()))
+	return nil
+}
+
+func (s *FeatureFlagService) responseLocked(key string) model.FeatureFlagResponse {
+	def, builtIn := model.LookupFeatureFlag(key)
+	resp := model.FeatureFlagResponse{
+		FeatureFlagTargets: model.FeatureFlagTargets{Users: []uuid.UUID{}, Departments: []string{}, Roles: []string{}},
+		Key:                key,
+		Description:        def.Description,
+		BuiltIn:            builtIn,
+		Default:            def.Default,
+		Enabled:            def.Default,
+	}
+	if def.Default {
+		resp.RolloutPercent = 100
+	}
+
+	if flag, ok := s.flags[key]; ok {
+		resp.FeatureFlagTargets = flag.Targets()
+		if flag.Description != "" {
+			resp.Description = flag.Description
+		}
+		resp.Overridden = true
+		resp.Enabled = flag.Enabled
+		resp.RolloutPercent = flag.RolloutPercent
+		resp.UpdatedBy = flag.UpdatedBy
+		updatedAt := flag.UpdatedAt
+		resp.UpdatedAt = &updatedAt
+	}
+	return resp
+}
+
+func nonNilUUIDs(ids []uuid.UUID) []uuid.UUID {
+	if ids == nil {
+		return []uuid.UUID{}
+	}
+	return ids
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
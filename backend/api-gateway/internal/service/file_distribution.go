@@ -0,0 +1,289 @@
+// Package service provides business logic for file distribution
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/ssh"
+	"gorm.io/gorm"
+)
+
+// maxDistributionFileSize limits the size of a staged distribution file (1GB)
+const maxDistributionFileSize = 1 << 30
+
+// distributionFetchTimeout bounds downloading a distribution file from its source URL
+const distributionFetchTimeout = 30 * time.Minute
+
+var (
+	// ErrFileTooLarge is returned for distribution files over the maximum size
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrSourceAddressNotAllowed is returned for source URLs that resolve to a
+	// loopback, private or link-local address
+	ErrSourceAddressNotAllowed = errors.New("source address not allowed")
+)
+
+// distributionFetchClient downloads distribution files. Its dialer checks the
+// resolved address of every connection, redirects included, so source URLs cannot
+// reach the gateway's own network or the cloud metadata endpoint.
+var distributionFetchClient = &http.Client{
+	Timeout: distributionFetchTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: refuseInternalAddress,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+	},
+}
+
+// refuseInternalAddress refuses connections to loopback, private, link-local and
+// unspecified addresses
+func refuseInternalAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrSourceAddressNotAllowed, host)
+	}
+	return nil
+}
+
+// DistributionStagingDir is the local directory where distribution files are staged
+var DistributionStagingDir = filepath.Join(os.TempDir(), "myops-distributions")
+
+// StagedFile describes a file staged locally before distribution
+type StagedFile struct {
+	Path     string
+	FileName string
+	Size     int64
+	Checksum string
+}
+
+// StageDistributionFile stores the content of r in the staging directory and computes its checksum
+func StageDistributionFile(distributionID uuid.UUID, fileName string, r io.Reader) (*StagedFile, error) {
+	if err := os.MkdirAll(DistributionStagingDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	stagedPath := filepath.Join(DistributionStagingDir, distributionID.String())
+	f, err := os.OpenFile(stagedPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staged file: %w", err)
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hasher), io.LimitReader(r, maxDistributionFileSize+1))
+	if err != nil {
+		os.Remove(stagedPath)
+		return nil, fmt.Errorf("failed to stage file: %w", err)
+	}
+	if size > maxDistributionFileSize {
+		os.Remove(stagedPath)
+		return nil, fmt.Errorf("%w: maximum size is %d bytes", ErrFileTooLarge, maxDistributionFileSize)
+	}
+
+	return &StagedFile{
+		Path:     stagedPath,
+		FileName: filepath.Base(fileName),
+		Size:     size,
+		Checksum: hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
+}
+
+// FetchDistributionFile downloads a file from an HTTP(S) or S3 URL into the staging directory.
+// s3://bucket/key URLs are resolved to the bucket's public HTTPS endpoint; use a presigned
+// HTTPS URL for private objects.
+func FetchDistributionFile(ctx context.Context, distributionID uuid.UUID, sourceURL string) (*StagedFile, error) {
+	fetchURL, err := resolveSourceURL(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fetchURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := distributionFetchClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch source file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("source returned status %d", resp.StatusCode)
+	}
+
+	return StageDistributionFile(distributionID, path.Base(fetchURL.Path), resp.Body)
+}
+
+// resolveSourceURL validates a source URL and maps s3:// URLs to HTTPS
+func resolveSourceURL(sourceURL string) (*url.URL, error) {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return u, nil
+	case "s3":
+		if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return nil, fmt.Errorf("s3 URL must be of the form s3://bucket/key")
+		}
+		return &url.URL{
+			Scheme: "https",
+			Host:   u.Host + ".s3.amazonaws.com",
+			Path:   u.Path,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported source URL scheme: %s", u.Scheme)
+	}
+}
+
+// ResolveHostSelector returns the available hosts matching the selector
+func ResolveHostSelector(db *gorm.DB, selector model.HostSelector) ([]model.Host, error) {
+	if selector.IsEmpty() {
+		return nil, fmt.Errorf("host selector is empty")
+	}
+
+	query := db.Model(&model.Host{}).Where("status IN ?",
+		[]model.HostStatus{model.HostStatusApproved, model.HostStatusOnline})
+
+	if len(selector.HostIDs) > 0 {
+		query = query.Where("id IN ?", selector.HostIDs)
+	}
+	if len(selector.Labels) > 0 {
+		labels, err := json.Marshal(selector.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector: %w", err)
+		}
+		query = query.Where("labels @> ?", string(labels))
+	}
+	if len(selector.Tags) > 0 {
+		query = query.Where("tags @> ?", pq.StringArray(selector.Tags))
+	}
+
+	var hosts []model.Host
+	if err := query.Find(&hosts).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve hosts: %w", err)
+	}
+	return hosts, nil
+}
+
+// distributeToHost pushes the staged file to one host and verifies its checksum
+func (e *BatchTaskExecutor) distributeToHost(host *model.Host, taskHost *model.BatchTaskHost) error {
+	var dist model.FileDistribution
+	if err := e.db.Where("batch_task_id = ?", taskHost.BatchTaskID).First(&dist).Error; err != nil {
+		return e.markHostFailed(taskHost, fmt.Sprintf("distribution not found: %v", err))
+	}
+
+	targetPath, err := ssh.ValidatePath(dist.TargetPath)
+	if err != nil {
+		return e.markHostFailed(taskHost, err.Error())
+	}
+
+	client, err := ssh.NewSFTPClient(&ssh.SFTPConfig{
+		HostID:     host.ID.String(),
+		IPAddress:  host.IPAddress,
+		Port:       host.Port,
+		Username:   "root", // TODO: Get from credentials
+		Password:   "",     // TODO: Get from credentials
+		PrivateKey: []byte{},
+		Timeout:    30 * time.Second,
+	})
+	if err != nil {
+		return e.markHostFailed(taskHost, fmt.Sprintf("failed to connect: %v", err))
+	}
+	defer client.Close()
+
+	if _, err := client.UploadFile(dist.StagedPath, targetPath, nil); err != nil {
+		return e.markHostFailed(taskHost, fmt.Sprintf("upload failed: %v", err))
+	}
+
+	if dist.Mode != "" {
+		if err := client.Chmod(targetPath, ssh.ParseMode(dist.Mode)); err != nil {
+			return e.markHostFailed(taskHost, err.Error())
+		}
+	}
+	if dist.Owner != "" {
+		if err := client.Chown(targetPath, dist.Owner, dist.Group); err != nil {
+			return e.markHostFailed(taskHost, err.Error())
+		}
+	}
+
+	if dist.Verify {
+		checksum, err := client.Checksum(targetPath)
+		if err != nil {
+			return e.markHostFailed(taskHost, fmt.Sprintf("verification failed: %v", err))
+		}
+		taskHost.Checksum = checksum
+		if checksum != dist.Checksum {
+			return e.markHostFailed(taskHost, fmt.Sprintf("checksum mismatch: expected %s, got %s", dist.Checksum, checksum))
+		}
+		taskHost.Verified = true
+	}
+
+	completedAt := time.Now()
+	exitCode := int32(0)
+	taskHost.Status = model.BatchTaskStatusCompleted
+	taskHost.ExitCode = &exitCode
+	taskHost.Stdout = fmt.Sprintf("%s -> %s (%d bytes)", dist.FileName, targetPath, dist.FileSize)
+	taskHost.Duration = completedAt.Sub(*taskHost.StartedAt).Milliseconds()
+	taskHost.CompletedAt = &completedAt
+
+	if err := e.db.Save(taskHost).Error; err != nil {
+		return fmt.Errorf("failed to update task host: %w", err)
+	}
+	return nil
+}
+
+// GetDistribution returns a file distribution with its per-host verification results
+func (e *BatchTaskExecutor) GetDistribution(taskID uuid.UUID) (*model.FileDistributionResponse, error) {
+	progress, err := e.GetTaskProgress(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	var dist model.FileDistribution
+	if err := e.db.Where("batch_task_id = ?", taskID).First(&dist).Error; err != nil {
+		return nil, fmt.Errorf("distribution not found: %w", err)
+	}
+	dist.BatchTask = progress.BatchTask
+
+	response := &model.FileDistributionResponse{
+		FileDistribution: &dist,
+		Progress:         progress.Progress,
+		Hosts:            progress.Hosts,
+	}
+	for _, h := range progress.Hosts {
+		if h.Verified {
+			response.VerifiedHosts++
+		} else if h.Checksum != "" && h.Checksum != dist.Checksum {
+			response.MismatchHosts++
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,1008 @@
+// Package service provides GitOps: directories of plain manifests in Git
+// branches applied to clusters and kept in sync, with pruning, drift detection
+// and a history of syncs to roll back to
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const (
+	// gitOpsScheduleInterval is how often sources due to be checked are looked for
+	gitOpsScheduleInterval = time.Minute
+	// gitOpsDefaultInterval is the seconds between checks of a source by default
+	gitOpsDefaultInterval = 300
+	// gitOpsMinInterval is the fewest seconds between checks of a source
+	gitOpsMinInterval = 60
+	// gitOpsSyncTimeout bounds a sync, fetching included
+	gitOpsSyncTimeout = 10 * time.Minute
+	// gitOpsCheckTimeout bounds a check of the branch and the live objects
+	gitOpsCheckTimeout = 2 * time.Minute
+	// gitOpsFieldManager owns the fields syncs apply
+	gitOpsFieldManager = "myops-gitops"
+	// gitOpsSourceLabel marks the objects a source manages; only those are pruned
+	gitOpsSourceLabel = "gitops.myops.io/source"
+)
+
+var gitCommitPattern = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+
+var (
+	// ErrGitOpsSourceNotFound is returned when the source does not exist or belongs to another user
+	ErrGitOpsSourceNotFound = errors.New("gitops source not found")
+	// ErrGitOpsSyncNotFound is returned when the sync does not exist
+	ErrGitOpsSyncNotFound = errors.New("gitops sync not found")
+	// ErrInvalidGitOpsSource is returned for sources whose configuration is malformed
+	ErrInvalidGitOpsSource = errors.New("invalid gitops source")
+	// ErrInvalidGitOpsManifest is returned when the repository's manifests cannot be applied
+	ErrInvalidGitOpsManifest = errors.New("invalid manifest")
+	// ErrGitOpsRepository is returned when the repository cannot be read
+	ErrGitOpsRepository = errors.New("git repository error")
+	// ErrGitOpsSyncInProgress is returned when the source is already being synced
+	ErrGitOpsSyncInProgress = errors.New("a sync of this source is already running")
+)
+
+// GitOpsOptions is the Git client syncs fetch with and where they clone
+type GitOpsOptions struct {
+	Git     string // git binary
+	WorkDir string // Where repositories are cloned; under the system temporary directory when empty
+}
+
+// GitOpsService keeps clusters in sync with the manifests of Git branches.
+// Sources are checked on their interval: new commits are applied when they
+// auto-sync, and objects changed in the cluster are re-applied when they
+// self-heal. Otherwise the source is reported out of sync.
+type GitOpsService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	opts   GitOpsOptions
+	events *EventBus
+}
+
+// NewGitOpsService creates a new GitOps service
+func NewGitOpsService(db *gorm.DB, logger *zap.Logger, opts GitOpsOptions) *GitOpsService {
+	if opts.Git == "" {
+		opts.Git = "git"
+	}
+	return &GitOpsService{db: db, logger: logger, opts: opts}
+}
+
+// SetEventBus sets the bus syncs are published on
+func (s *GitOpsService) SetEventBus(events *EventBus) {
+	s.events = events
+}
+
+func (s *GitOpsService) workDir() string {
+	if s.opts.WorkDir != "" {
+		return s.opts.WorkDir
+	}
+	return filepath.Join(os.TempDir(), "myops-gitops")
+}
+
+// ============== Sources ==============
+
+// Sources lists the user's sources by name, optionally those of one cluster
+func (s *GitOpsService) Sources(userID uuid.UUID, clusterID *uuid.UUID) ([]model.GitOpsSource, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if clusterID != nil {
+		query = query.Where("cluster_id = ?", *clusterID)
+	}
+	var sources []model.GitOpsSource
+	err := query.Order("name").Find(&sources).Error
+	return sources, err
+}
+
+// Source gets one of the user's sources
+func (s *GitOpsService) Source(userID, id uuid.UUID) (*model.GitOpsSource, error) {
+	var source model.GitOpsSource
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&source).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGitOpsSourceNotFound
+		}
+		return nil, err
+	}
+	return &source, nil
+}
+
+// Create adds a source. It is checked, and synced when it auto-syncs, within a
+// minute.
+func (s *GitOpsService) Create(userID uuid.UUID, createdBy string, req *model.CreateGitOpsSourceRequest) (*model.GitOpsSource, error) {
+	if err := s.db.Where("id = ? AND user_id = ?", req.ClusterID, userID).First(&model.K8sCluster{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrClusterNotFound
+		}
+		return nil, err
+	}
+
+	source := &model.GitOpsSource{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Name:         strings.TrimSpace(req.Name),
+		Description:  req.Description,
+		RepoURL:      strings.TrimSpace(req.RepoURL),
+		Branch:       strings.TrimSpace(req.Branch),
+		Path:         strings.TrimSpace(req.Path),
+		AuthType:     req.AuthType,
+		Username:     req.Username,
+		Password:     req.Password,
+		SSHKey:       req.SSHKey,
+		ClusterID:    req.ClusterID,
+		Namespace:    strings.TrimSpace(req.Namespace),
+		AutoSync:     req.AutoSync,
+		Prune:        req.Prune,
+		SelfHeal:     req.SelfHeal,
+		SyncInterval: req.SyncInterval,
+		Status:       model.GitOpsPending,
+		Resources:    []model.GitOpsResource{},
+		NextCheckAt:  time.Now(),
+		CreatedBy:    createdBy,
+	}
+	if err := validateGitOpsSource(source); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(source).Error; err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// Update changes a source. Moving it to another repository, branch or path
+// checks it again within a minute; the objects it applied stay until the next
+// sync prunes them.
+func (s *GitOpsService) Update(userID, id uuid.UUID, req *model.UpdateGitOpsSourceRequest) (*model.GitOpsSource, error) {
+	source, err := s.Source(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	moved := false
+	set := func(field *string, value *string, tracked bool) {
+		if value != nil && strings.TrimSpace(*value) != *field {
+			*field = strings.TrimSpace(*value)
+			moved = moved || tracked
+		}
+	}
+	set(&source.Name, req.Name, false)
+	set(&source.RepoURL, req.RepoURL, true)
+	set(&source.Branch, req.Branch, true)
+	set(&source.Path, req.Path, true)
+	set(&source.Namespace, req.Namespace, true)
+	set(&source.Username, req.Username, false)
+	if req.Description != nil {
+		source.Description = *req.Description
+	}
+	if req.AuthType != nil {
+		source.AuthType = *req.AuthType
+	}
+	if req.Password != nil && *req.Password != "" {
+		source.Password = *req.Password
+	}
+	if req.SSHKey != nil && *req.SSHKey != "" {
+		source.SSHKey = *req.SSHKey
+	}
+	if req.AutoSync != nil {
+		source.AutoSync = *req.AutoSync
+	}
+	if req.Prune != nil {
+		source.Prune = *req.Prune
+	}
+	if req.SelfHeal != nil {
+		source.SelfHeal = *req.SelfHeal
+	}
+	if req.SyncInterval != nil {
+		source.SyncInterval = *req.SyncInterval
+	}
+	if err := validateGitOpsSource(source); err != nil {
+		return nil, err
+	}
+	if moved || req.AutoSync != nil || req.SelfHeal != nil {
+		source.NextCheckAt = time.Now()
+	}
+	if moved {
+		source.HeadRevision = ""
+	}
+
+	// The columns a running sync or check writes are left to it
+	if err := s.db.Model(source).Select("Name", "Description", "RepoURL", "Branch", "Path", "AuthType",
+		"Username", "Password", "SSHKey", "Namespace", "AutoSync", "Prune", "SelfHeal", "SyncInterval",
+		"HeadRevision", "NextCheckAt").Updates(source).Error; err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// Delete removes a source and its sync history. With prune, the objects it
+// manages are deleted from the cluster first.
+func (s *GitOpsService) Delete(ctx context.Context, userID, id uuid.UUID, prune bool) error {
+	source, err := s.Source(userID, id)
+	if err != nil {
+		return err
+	}
+	if prune && len(source.Resources) > 0 {
+		cluster, manifests, err := s.manifestClient(source)
+		if err != nil {
+			return err
+		}
+		defer cluster.Close()
+		for _, resource := range gitOpsPruneOrder(source.Resources) {
+			if _, err := s.prune(ctx, manifests, source, gitOpsRef(resource)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("source_id = ?", source.ID).Delete(&model.GitOpsSync{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(source).Error
+	})
+}
+
+func validateGitOpsSource(source *model.GitOpsSource) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidGitOpsSource, fmt.Sprintf(format, args...))
+	}
+	if source.Name == "" {
+		return invalid("name is required")
+	}
+	if source.Branch == "" {
+		source.Branch = "main"
+	}
+	if strings.HasPrefix(source.Branch, "-") || strings.ContainsAny(source.Branch, " ~^:?*[\\") {
+		return invalid("invalid branch %q", source.Branch)
+	}
+	if source.Path = strings.Trim(path.Clean("/"+source.Path), "/"); strings.HasPrefix(source.Path, "-") {
+		return invalid("invalid path %q", source.Path)
+	}
+	if source.Namespace != "" && !namespacePattern.MatchString(source.Namespace) {
+		return invalid("invalid namespace %q", source.Namespace)
+	}
+	if source.SyncInterval == 0 {
+		source.SyncInterval = gitOpsDefaultInterval
+	}
+	if source.SyncInterval < gitOpsMinInterval {
+		return invalid("sync interval must be at least %d seconds", gitOpsMinInterval)
+	}
+
+	if source.AuthType == "" {
+		source.AuthType = model.GitOpsAuthNone
+	}
+	ssh := strings.HasPrefix(source.RepoURL, "git@") || strings.HasPrefix(source.RepoURL, "ssh://")
+	if !ssh {
+		u, err := url.Parse(source.RepoURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return invalid("repository URL must be an HTTPS or SSH URL")
+		}
+		if u.User != nil {
+			return invalid("put credentials in the username and password, not the URL")
+		}
+	}
+	switch source.AuthType {
+	case model.GitOpsAuthNone:
+		source.Username, source.Password, source.SSHKey = "", "", ""
+	case model.GitOpsAuthBasic:
+		if ssh {
+			return invalid("basic authentication needs an HTTPS URL")
+		}
+		if source.Password == "" {
+			return invalid("a password or access token is required")
+		}
+		source.SSHKey = ""
+	case model.GitOpsAuthSSH:
+		if !ssh {
+			return invalid("SSH authentication needs an SSH URL")
+		}
+		if !strings.Contains(source.SSHKey, "PRIVATE KEY") {
+			return invalid("a private key is required")
+		}
+		source.Username, source.Password = "", ""
+	default:
+		return invalid("unknown authentication type %q", source.AuthType)
+	}
+	return nil
+}
+
+// ============== Syncs ==============
+
+// Syncs lists a source's syncs, newest first
+func (s *GitOpsService) Syncs(userID, id uuid.UUID, limit int) ([]model.GitOpsSync, error) {
+	if _, err := s.Source(userID, id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	var syncs []model.GitOpsSync
+	err := s.db.Where("source_id = ?", id).Order("started_at DESC").Limit(limit).Find(&syncs).Error
+	return syncs, err
+}
+
+// Sync starts a sync of the source and returns its record while it runs
+func (s *GitOpsService) Sync(userID uuid.UUID, triggeredBy string, id uuid.UUID, req *model.SyncGitOpsSourceRequest) (*model.GitOpsSync, error) {
+	source, err := s.Source(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	revision := strings.TrimSpace(req.Revision)
+	if revision == "" {
+		revision = source.Branch
+	} else if strings.HasPrefix(revision, "-") {
+		return nil, fmt.Errorf("%w: invalid revision %q", ErrInvalidGitOpsSource, revision)
+	}
+	prune := source.Prune
+	if req.Prune != nil {
+		prune = *req.Prune
+	}
+
+	record, err := s.begin(source, model.GitOpsTriggerManual, triggeredBy)
+	if err != nil {
+		return nil, err
+	}
+	go s.run(source, record, revision, prune)
+	return record, nil
+}
+
+// Rollback re-applies the commit of an earlier successful sync and turns
+// auto-sync off, so the branch does not undo it. Self-healing keeps the
+// rolled-back objects in place.
+func (s *GitOpsService) Rollback(userID uuid.UUID, triggeredBy string, id uuid.UUID, req *model.RollbackGitOpsSourceRequest) (*model.GitOpsSync, error) {
+	source, err := s.Source(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	var target model.GitOpsSync
+	if err := s.db.Where("id = ? AND source_id = ?", req.SyncID, source.ID).First(&target).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGitOpsSyncNotFound
+		}
+		return nil, err
+	}
+	if target.Status != model.GitOpsSyncSucceeded || target.Revision == "" {
+		return nil, fmt.Errorf("%w: only successful syncs can be rolled back to", ErrInvalidGitOpsSource)
+	}
+
+	record, err := s.begin(source, model.GitOpsTriggerRollback, triggeredBy)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(source).Update("auto_sync", false).Error; err != nil {
+		s.logger.Error("failed to turn auto-sync off", zap.String("sourceId", source.ID.String()), zap.Error(err))
+	}
+	source.AutoSync = false
+	go s.run(source, record, target.Revision, source.Prune)
+	return record, nil
+}
+
+// begin records a running sync unless the source already has one
+func (s *GitOpsService) begin(source *model.GitOpsSource, trigger model.GitOpsSyncTrigger, triggeredBy string) (*model.GitOpsSync, error) {
+	record := &model.GitOpsSync{
+		ID:          uuid.New(),
+		SourceID:    source.ID,
+		Trigger:     trigger,
+		Status:      model.GitOpsSyncRunning,
+		Resources:   []model.GitOpsSyncedResource{},
+		TriggeredBy: triggeredBy,
+		StartedAt:   time.Now(),
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var running int64
+		if err := tx.Model(&model.GitOpsSync{}).Where("source_id = ? AND status = ?", source.ID, model.GitOpsSyncRunning).Count(&running).Error; err != nil {
+			return err
+		}
+		if running > 0 {
+			return ErrGitOpsSyncInProgress
+		}
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+		return tx.Model(source).Update("status", model.GitOpsSyncing).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	source.Status = model.GitOpsSyncing
+	return record, nil
+}
+
+// run applies revision and records how the sync ended on it and its source
+func (s *GitOpsService) run(source *model.GitOpsSource, record *model.GitOpsSync, revision string, prune bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitOpsSyncTimeout)
+	defer cancel()
+
+	resources, err := s.apply(ctx, source, record, revision, prune)
+	now := time.Now()
+	record.FinishedAt = &now
+	columns := []string{"Status", "Message", "LastSyncAt"}
+	switch {
+	case err != nil:
+		record.Status = model.GitOpsSyncFailed
+		record.Message = err.Error()
+		source.Status = model.GitOpsFailed
+		source.Message = err.Error()
+	case record.Failed > 0:
+		record.Status = model.GitOpsSyncFailed
+		record.Message = fmt.Sprintf("%d of %d objects failed", record.Failed, len(record.Resources))
+		source.Status = model.GitOpsFailed
+		source.Message = record.Message
+		source.Resources = resources
+		columns = append(columns, "Resources")
+	default:
+		record.Status = model.GitOpsSyncSucceeded
+		source.Status = model.GitOpsSynced
+		source.Message = ""
+		source.Revision = record.Revision
+		source.Resources = resources
+		columns = append(columns, "Revision", "Resources")
+		if revision == source.Branch {
+			source.HeadRevision = record.Revision
+			columns = append(columns, "HeadRevision")
+		}
+	}
+	source.LastSyncAt = &now
+
+	if err := s.db.Save(record).Error; err != nil {
+		s.logger.Error("failed to record gitops sync", zap.String("sourceId", source.ID.String()), zap.Error(err))
+	}
+	if err := s.db.Model(source).Select(columns).Updates(source).Error; err != nil {
+		s.logger.Error("failed to record gitops source status", zap.String("sourceId", source.ID.String()), zap.Error(err))
+	}
+	if record.Status == model.GitOpsSyncFailed {
+		s.logger.Warn("gitops sync failed", zap.String("source", source.Name), zap.String("message", record.Message))
+	} else {
+		s.logger.Info("gitops sync succeeded", zap.String("source", source.Name), zap.String("revision", record.Revision),
+			zap.Int("applied", record.Applied), zap.Int("pruned", record.Pruned))
+	}
+	s.events.Publish(source.UserID, model.EventGitOpsSynced, map[string]string{
+		"sourceId":  source.ID.String(),
+		"clusterId": source.ClusterID.String(),
+		"trigger":   string(record.Trigger),
+		"status":    string(record.Status),
+	}, record)
+}
+
+// apply fetches revision, applies its manifests and prunes the objects of the
+// previous sync it no longer has. It returns the objects the source manages
+// afterwards; an error means nothing was applied.
+func (s *GitOpsService) apply(ctx context.Context, source *model.GitOpsSource, record *model.GitOpsSync, revision string, prune bool) ([]model.GitOpsResource, error) {
+	checkout, err := s.checkout(source)
+	if err != nil {
+		return nil, err
+	}
+	defer checkout.Close()
+
+	commit, err := checkout.fetch(ctx, revision)
+	if err != nil {
+		return nil, err
+	}
+	record.Revision = commit
+	record.CommitAuthor, record.CommitMessage = checkout.commit(ctx, commit)
+	if err := s.db.Model(record).Select("Revision", "CommitAuthor", "CommitMessage").Updates(record).Error; err != nil {
+		s.logger.Error("failed to record gitops sync revision", zap.String("sourceId", source.ID.String()), zap.Error(err))
+	}
+
+	files, err := checkout.files(ctx, commit, source.Path)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := gitOpsManifests(files)
+	if err != nil {
+		return nil, err
+	}
+	cluster, manifests, err := s.manifestClient(source)
+	if err != nil {
+		return nil, err
+	}
+	defer cluster.Close()
+
+	resources := []model.GitOpsResource{}
+	applied := map[k8s.ObjectRef]bool{}
+	refresh := false
+	for _, object := range objects {
+		if refresh && k8s.RefOf(object).Kind != "CustomResourceDefinition" {
+			// Resources of the definitions just applied can now be mapped
+			if err := manifests.Refresh(); err != nil {
+				return nil, err
+			}
+			refresh = false
+		}
+
+		resource, action, err := s.applyObject(ctx, manifests, source, object)
+		synced := model.GitOpsSyncedResource{
+			APIVersion: resource.APIVersion, Kind: resource.Kind, Namespace: resource.Namespace, Name: resource.Name,
+			Action: action,
+		}
+		switch {
+		case err != nil:
+			synced.Message = err.Error()
+			resource.State = model.GitOpsResourceFailed
+			resource.Message = err.Error()
+			record.Failed++
+		case action != model.GitOpsActionUnchanged:
+			record.Applied++
+			refresh = refresh || resource.Kind == "CustomResourceDefinition"
+		}
+		record.Resources = append(record.Resources, synced)
+		resources = append(resources, resource)
+		applied[gitOpsRef(resource)] = true
+	}
+
+	for _, previous := range gitOpsPruneOrder(source.Resources) {
+		ref := gitOpsRef(previous)
+		if applied[ref] {
+			continue
+		}
+		if !prune {
+			previous.State = model.GitOpsResourceOrphaned
+			previous.Drift, previous.Message = nil, ""
+			resources = append(resources, previous)
+			continue
+		}
+		synced := model.GitOpsSyncedResource{
+			APIVersion: ref.APIVersion, Kind: ref.Kind, Namespace: ref.Namespace, Name: ref.Name,
+			Action: model.GitOpsActionPruned,
+		}
+		deleted, err := s.prune(ctx, manifests, source, ref)
+		if err != nil {
+			synced.Action = model.GitOpsActionFailed
+			synced.Message = err.Error()
+			previous.State = model.GitOpsResourceFailed
+			previous.Message = err.Error()
+			resources = append(resources, previous) // Pruned again by the next sync
+			record.Failed++
+		} else if deleted {
+			record.Pruned++
+		} else {
+			continue
+		}
+		record.Resources = append(record.Resources, synced)
+	}
+	return resources, nil
+}
+
+// applyObject applies one manifest unless the live object matches it already
+func (s *GitOpsService) applyObject(ctx context.Context, manifests *k8s.ManifestClient, source *model.GitOpsSource, object map[string]interface{}) (model.GitOpsResource, model.GitOpsSyncAction, error) {
+	ref, err := s.prepare(manifests, source, object)
+	resource := model.GitOpsResource{
+		APIVersion: ref.APIVersion, Kind: ref.Kind, Namespace: ref.Namespace, Name: ref.Name,
+		State: model.GitOpsResourceSynced,
+	}
+	if err != nil {
+		return resource, model.GitOpsActionFailed, err
+	}
+
+	live, err := manifests.Get(ctx, ref)
+	if err != nil {
+		return resource, model.GitOpsActionFailed, err
+	}
+	action := model.GitOpsActionCreated
+	if live != nil {
+		if len(k8s.ManifestDrift(object, live)) == 0 {
+			return resource, model.GitOpsActionUnchanged, nil
+		}
+		action = model.GitOpsActionConfigured
+	}
+	if _, err := manifests.Apply(ctx, object, false); err != nil {
+		return resource, model.GitOpsActionFailed, err
+	}
+	return resource, action, nil
+}
+
+// prepare sets the source's namespace on namespaced manifests that name none,
+// and the label that marks them as the source's
+func (s *GitOpsService) prepare(manifests *k8s.ManifestClient, source *model.GitOpsSource, object map[string]interface{}) (k8s.ObjectRef, error) {
+	ref := k8s.RefOf(object)
+	metadata, _ := object["metadata"].(map[string]interface{})
+	namespaced, err := manifests.Namespaced(ref.APIVersion, ref.Kind)
+	if err != nil {
+		return ref, err
+	}
+	switch {
+	case !namespaced:
+		delete(metadata, "namespace")
+		ref.Namespace = ""
+	case ref.Namespace == "" && source.Namespace == "":
+		return ref, fmt.Errorf("%s: %w; set it in the manifest or on the source", ref, k8s.ErrNamespaceRequired)
+	case ref.Namespace == "":
+		metadata["namespace"] = source.Namespace
+		ref.Namespace = source.Namespace
+	}
+
+	labels, _ := metadata["labels"].(map[string]interface{})
+	if labels == nil {
+		labels = map[string]interface{}{}
+		metadata["labels"] = labels
+	}
+	labels[gitOpsSourceLabel] = source.ID.String()
+	labels["app.kubernetes.io/managed-by"] = "myops"
+	return ref, nil
+}
+
+// prune deletes an object of the source. Objects another source or a person
+// took over, without the source's label, are left alone.
+func (s *GitOpsService) prune(ctx context.Context, manifests *k8s.ManifestClient, source *model.GitOpsSource, ref k8s.ObjectRef) (bool, error) {
+	live, err := manifests.Get(ctx, ref)
+	if errors.Is(err, k8s.ErrUnknownKind) {
+		return false, nil // Its definition was pruned first
+	}
+	if err != nil {
+		return false, err
+	}
+	if live == nil || gitOpsOwner(live) != source.ID.String() {
+		return false, nil
+	}
+	if err := manifests.Delete(ctx, ref); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *GitOpsService) manifestClient(source *model.GitOpsSource) (*k8s.ClusterClient, *k8s.ManifestClient, error) {
+	var cluster model.K8sCluster
+	if err := s.db.Where("id = ?", source.ClusterID).First(&cluster).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrClusterNotFound
+		}
+		return nil, nil, err
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+	manifests, err := client.NewManifestClient(gitOpsFieldManager)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return client, manifests, nil
+}
+
+// ============== Checks ==============
+
+// Run checks due sources every minute until ctx is done. Syncs left running by
+// a previous gateway are marked failed first.
+func (s *GitOpsService) Run(ctx context.Context) {
+	if err := s.Recover(); err != nil {
+		s.logger.Error("failed to mark interrupted gitops syncs", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(gitOpsScheduleInterval)
+	defer ticker.Stop()
+	for {
+		s.CheckDue(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Recover marks syncs that have been running longer than a sync may take as
+// failed, and their sources with them
+func (s *GitOpsService) Recover() error {
+	var interrupted []model.GitOpsSync
+	if err := s.db.Where("status = ? AND started_at < ?", model.GitOpsSyncRunning, time.Now().Add(-gitOpsSyncTimeout)).
+		Find(&interrupted).Error; err != nil {
+		return err
+	}
+	for _, record := range interrupted {
+		now := time.Now()
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&record).Updates(map[string]interface{}{
+				"status":      model.GitOpsSyncFailed,
+				"message":     "sync was interrupted",
+				"finished_at": now,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&model.GitOpsSource{}).Where("id = ? AND status = ?", record.SourceID, model.GitOpsSyncing).
+				Updates(map[string]interface{}{"status": model.GitOpsFailed, "message": "sync was interrupted"}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckDue checks every source whose next check has come. A source is claimed
+// by moving its next check, so each check happens once with several gateway
+// replicas.
+func (s *GitOpsService) CheckDue(ctx context.Context, now time.Time) {
+	var due []model.GitOpsSource
+	if err := s.db.Where("next_check_at <= ? AND status <> ?", now, model.GitOpsSyncing).Find(&due).Error; err != nil {
+		s.logger.Error("failed to load gitops sources", zap.Error(err))
+		return
+	}
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		source := &due[i]
+		next := now.Add(time.Duration(source.SyncInterval) * time.Second)
+		claim := s.db.Model(&model.GitOpsSource{}).
+			Where("id = ? AND next_check_at = ?", source.ID, source.NextCheckAt).
+			Update("next_check_at", next)
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+		source.NextCheckAt = next
+		go s.check(source)
+	}
+}
+
+// check compares the source's branch and live objects to the commit it last
+// applied. New commits are synced when it auto-syncs and drifted objects when
+// it self-heals; otherwise the source is reported out of sync.
+func (s *GitOpsService) check(source *model.GitOpsSource) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitOpsCheckTimeout)
+	defer cancel()
+
+	head, resources, err := s.compare(ctx, source)
+	now := time.Now()
+	source.CheckedAt = &now
+	columns := []string{"CheckedAt", "Status", "Message"}
+	trigger := model.GitOpsSyncTrigger("")
+	switch {
+	case err != nil:
+		source.Status = model.GitOpsFailed
+		source.Message = err.Error()
+	default:
+		source.HeadRevision = head
+		columns = append(columns, "HeadRevision")
+		drifted, failed := 0, 0
+		if resources != nil {
+			source.Resources = resources
+			columns = append(columns, "Resources")
+			for _, resource := range resources {
+				switch resource.State {
+				case model.GitOpsResourceDrifted, model.GitOpsResourceMissing:
+					drifted++
+				case model.GitOpsResourceFailed:
+					failed++
+				}
+			}
+		}
+		switch {
+		case head != source.Revision && source.AutoSync:
+			trigger = model.GitOpsTriggerAuto
+		case head != source.Revision && source.Revision == "":
+			source.Status = model.GitOpsOutOfSync
+			source.Message = "The branch has never been synced"
+		case head != source.Revision:
+			source.Status = model.GitOpsOutOfSync
+			source.Message = fmt.Sprintf("The branch is at %s; the cluster is at %s", gitShortCommit(head), gitShortCommit(source.Revision))
+		case drifted > 0 && source.SelfHeal:
+			trigger = model.GitOpsTriggerSelfHeal
+		case drifted > 0:
+			source.Status = model.GitOpsOutOfSync
+			source.Message = fmt.Sprintf("%d objects differ from their manifests", drifted)
+		case failed > 0:
+			source.Status = model.GitOpsFailed
+			source.Message = fmt.Sprintf("%d objects could not be compared to their manifests", failed)
+		default:
+			source.Status = model.GitOpsSynced
+			source.Message = ""
+		}
+	}
+
+	if trigger != "" {
+		revision := source.Branch
+		if trigger == model.GitOpsTriggerSelfHeal {
+			revision = source.Revision
+		}
+		if err := s.db.Model(source).Select(columns).Updates(source).Error; err != nil {
+			s.logger.Error("failed to record gitops check", zap.String("sourceId", source.ID.String()), zap.Error(err))
+		}
+		record, err := s.begin(source, trigger, "")
+		if err != nil {
+			if !errors.Is(err, ErrGitOpsSyncInProgress) {
+				s.logger.Error("failed to start gitops sync", zap.String("source", source.Name), zap.Error(err))
+			}
+			return
+		}
+		s.run(source, record, revision, source.Prune)
+		return
+	}
+
+	// A sync that started meanwhile records the status itself
+	err = s.db.Model(source).Where("status <> ?", model.GitOpsSyncing).Select(columns).Updates(source).Error
+	if err != nil {
+		s.logger.Error("failed to record gitops check", zap.String("sourceId", source.ID.String()), zap.Error(err))
+	}
+}
+
+// compare returns the newest commit of the source's branch and, once the
+// source was synced, its objects compared to the manifests of the commit
+func (s *GitOpsService) compare(ctx context.Context, source *model.GitOpsSource) (string, []model.GitOpsResource, error) {
+	checkout, err := s.checkout(source)
+	if err != nil {
+		return "", nil, err
+	}
+	defer checkout.Close()
+
+	head, err := checkout.head(ctx, source.Branch)
+	if err != nil || source.Revision == "" {
+		return head, nil, err
+	}
+	if _, err := checkout.fetch(ctx, source.Revision); err != nil {
+		return "", nil, err
+	}
+	files, err := checkout.files(ctx, source.Revision, source.Path)
+	if err != nil {
+		return "", nil, err
+	}
+	objects, err := gitOpsManifests(files)
+	if err != nil {
+		return "", nil, err
+	}
+	cluster, manifests, err := s.manifestClient(source)
+	if err != nil {
+		return "", nil, err
+	}
+	defer cluster.Close()
+
+	resources := make([]model.GitOpsResource, 0, len(objects))
+	compared := map[k8s.ObjectRef]bool{}
+	for _, object := range objects {
+		ref, err := s.prepare(manifests, source, object)
+		resource := model.GitOpsResource{
+			APIVersion: ref.APIVersion, Kind: ref.Kind, Namespace: ref.Namespace, Name: ref.Name,
+			State: model.GitOpsResourceSynced,
+		}
+		var live map[string]interface{}
+		if err == nil {
+			live, err = manifests.Get(ctx, ref)
+		}
+		switch {
+		case err != nil:
+			resource.State = model.GitOpsResourceFailed
+			resource.Message = err.Error()
+		case live == nil:
+			resource.State = model.GitOpsResourceMissing
+		default:
+			if resource.Drift = k8s.ManifestDrift(object, live); len(resource.Drift) > 0 {
+				resource.State = model.GitOpsResourceDrifted
+			}
+		}
+		resources = append(resources, resource)
+		compared[gitOpsRef(resource)] = true
+	}
+	for _, previous := range source.Resources {
+		if !compared[gitOpsRef(previous)] && previous.State == model.GitOpsResourceOrphaned {
+			resources = append(resources, previous)
+		}
+	}
+	return head, resources, nil
+}
+
+// ============== Manifests ==============
+
+// gitOpsManifests parses the objects of manifest files, expanding lists, in
+// the order they should be applied
+func gitOpsManifests(files map[string][]byte) ([]map[string]interface{}, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var objects []map[string]interface{}
+	seen := map[k8s.ObjectRef]string{}
+	add := func(name string, object map[string]interface{}) error {
+		ref := k8s.RefOf(object)
+		if ref.APIVersion == "" || ref.Kind == "" || ref.Name == "" {
+			return fmt.Errorf("%w: %s: objects need an apiVersion, a kind and a name", ErrInvalidGitOpsManifest, name)
+		}
+		if other, ok := seen[ref]; ok {
+			return fmt.Errorf("%w: %s is in both %s and %s", ErrInvalidGitOpsManifest, ref, other, name)
+		}
+		seen[ref] = name
+		objects = append(objects, object)
+		return nil
+	}
+
+	for _, name := range names {
+		for _, document := range helmDocumentSeparator.Split(string(files[name]), -1) {
+			var parsed interface{}
+			if err := yaml.Unmarshal([]byte(document), &parsed); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidGitOpsManifest, name, err)
+			}
+			if parsed == nil {
+				continue
+			}
+			object, ok := normalizeHelmValue(parsed).(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%w: %s: a document is not a Kubernetes object", ErrInvalidGitOpsManifest, name)
+			}
+			kind, _ := object["kind"].(string)
+			items, isList := object["items"].([]interface{})
+			if !isList || !strings.HasSuffix(kind, "List") {
+				if err := add(name, object); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			for _, item := range items {
+				itemObject, ok := item.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%w: %s: a list item is not a Kubernetes object", ErrInvalidGitOpsManifest, name)
+				}
+				if err := add(name, itemObject); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		return gitOpsKindOrder(k8s.RefOf(objects[i]).Kind) < gitOpsKindOrder(k8s.RefOf(objects[j]).Kind)
+	})
+	return objects, nil
+}
+
+// gitOpsKinds are applied first, in this order, so objects find the
+// namespaces, definitions, accounts and configuration they use
+var gitOpsKinds = []string{
+	"Namespace", "CustomResourceDefinition", "PriorityClass", "StorageClass", "ServiceAccount",
+	"Secret", "ConfigMap", "PersistentVolume", "PersistentVolumeClaim", "ClusterRole",
+	"ClusterRoleBinding", "Role", "RoleBinding", "Service",
+}
+
+func gitOpsKindOrder(kind string) int {
+	for i, k := range gitOpsKinds {
+		if k == kind {
+			return i
+		}
+	}
+	return len(gitOpsKinds)
+}
+
+// gitOpsPruneOrder returns resources in the order they are deleted, the
+// reverse of the order they are applied
+func gitOpsPruneOrder(resources []model.GitOpsResource) []model.GitOpsResource {
+	ordered := append([]model.GitOpsResource(nil), resources...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return gitOpsKindOrder(ordered[i].Kind) > gitOpsKindOrder(ordered[j].Kind)
+	})
+	return ordered
+}
+
+func gitOpsRef(resource model.GitOpsResource) k8s.ObjectRef {
+	return k8s.ObjectRef{APIVersion: resource.APIVersion, Kind: resource.Kind, Namespace: resource.Namespace, Name: resource.Name}
+}
+
+// gitOpsOwner returns the ID of the source that manages a live object
+func gitOpsOwner(object map[string]interface{}) string {
+	metadata, _ := object["metadata"].(map[string]interface{})
+	labels, _ := metadata["labels"].(map[string]interface{})
+	owner, _ := labels[gitOpsSourceLabel].(string)
+	return owner
+}
+
+func gitShortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
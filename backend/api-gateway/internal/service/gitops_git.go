@@ -0,0 +1,199 @@
+// Package service provides the Git checkouts GitOps sources read their
+// manifests from
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+const (
+	// gitOpsMaxFiles bounds the manifest files a sync reads
+	gitOpsMaxFiles = 2000
+	// gitOpsMaxBytes bounds the size of the manifests a sync reads
+	gitOpsMaxBytes = 32 << 20
+)
+
+// gitCheckout is a source's bare clone, fetched shallowly at the commits its
+// syncs apply. Credentials go through the environment, never the command line.
+type gitCheckout struct {
+	git     string
+	dir     string
+	url     string
+	env     []string
+	cleanup func()
+}
+
+// checkout opens the source's clone under the work directory, creating it the
+// first time. Close it to remove the key file of SSH sources.
+func (s *GitOpsService) checkout(source *model.GitOpsSource) (*gitCheckout, error) {
+	dir := filepath.Join(s.workDir(), source.ID.String())
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create checkout directory: %w", err)
+	}
+	c := &gitCheckout{
+		git:     s.opts.Git,
+		dir:     dir,
+		url:     source.RepoURL,
+		env:     append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_DIR="+dir),
+		cleanup: func() {},
+	}
+
+	switch source.AuthType {
+	case model.GitOpsAuthBasic:
+		credentials := base64.StdEncoding.EncodeToString([]byte(source.Username + ":" + source.Password))
+		c.env = append(c.env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+credentials,
+		)
+	case model.GitOpsAuthSSH:
+		key, err := os.CreateTemp(dir, "key-") // Readable by the owner only
+		if err != nil {
+			return nil, fmt.Errorf("failed to write SSH key: %w", err)
+		}
+		keyFile := key.Name()
+		c.cleanup = func() { os.Remove(keyFile) }
+		_, err = key.WriteString(strings.TrimSpace(source.SSHKey) + "\n")
+		if closeErr := key.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			c.cleanup()
+			return nil, fmt.Errorf("failed to write SSH key: %w", err)
+		}
+		c.env = append(c.env, fmt.Sprintf(
+			"GIT_SSH_COMMAND=ssh -i '%s' -o IdentitiesOnly=yes -o BatchMode=yes -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile='%s'",
+			keyFile, filepath.Join(dir, "known_hosts")))
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); os.IsNotExist(err) {
+		if _, err := c.run(context.Background(), "init", "--bare", "--quiet"); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Close removes the checkout's key file
+func (c *gitCheckout) Close() {
+	c.cleanup()
+}
+
+func (c *gitCheckout) run(ctx context.Context, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.git, args...)
+	cmd.Env = c.env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, fmt.Errorf("%w: git %s: %s", ErrGitOpsRepository, args[0], message)
+	}
+	return stdout.Bytes(), nil
+}
+
+// head returns the newest commit of branch without fetching it
+func (c *gitCheckout) head(ctx context.Context, branch string) (string, error) {
+	out, err := c.run(ctx, "ls-remote", "--heads", c.url, "refs/heads/"+branch)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%w: branch %s not found", ErrGitOpsRepository, branch)
+	}
+	return fields[0], nil
+}
+
+// fetch fetches revision, a branch or commit, and returns its commit. Commits
+// fetched before are not fetched again.
+func (c *gitCheckout) fetch(ctx context.Context, revision string) (string, error) {
+	if gitCommitPattern.MatchString(revision) {
+		if _, err := c.run(ctx, "cat-file", "-e", revision+"^{commit}"); err == nil {
+			return revision, nil
+		}
+	}
+	if _, err := c.run(ctx, "fetch", "--quiet", "--depth", "1", "--no-tags", c.url, revision); err != nil {
+		return "", err
+	}
+	out, err := c.run(ctx, "rev-parse", "--verify", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// commit returns the author and subject of a fetched commit
+func (c *gitCheckout) commit(ctx context.Context, revision string) (string, string) {
+	out, err := c.run(ctx, "log", "-1", "--format=%an%x00%s", revision)
+	if err != nil {
+		return "", ""
+	}
+	author, subject, _ := strings.Cut(strings.TrimSpace(string(out)), "\x00")
+	return author, subject
+}
+
+// files reads the manifest files under dir at a fetched commit, by their path
+// in the repository
+func (c *gitCheckout) files(ctx context.Context, revision, dir string) (map[string][]byte, error) {
+	args := []string{"archive", "--format=tar", revision}
+	if dir = strings.Trim(path.Clean("/"+dir), "/"); dir != "" {
+		args = append(args, "--", dir)
+	}
+	out, err := c.run(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+	total := 0
+	reader := tar.NewReader(bytes.NewReader(out))
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read archive: %v", ErrGitOpsRepository, err)
+		}
+		if header.Typeflag != tar.TypeReg || !gitOpsManifestFile(header.Name) {
+			continue
+		}
+		total += int(header.Size)
+		if len(files) >= gitOpsMaxFiles || total > gitOpsMaxBytes {
+			return nil, fmt.Errorf("%w: more than %d files or %d MiB of manifests", ErrInvalidGitOpsManifest, gitOpsMaxFiles, gitOpsMaxBytes>>20)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read %s: %v", ErrGitOpsRepository, header.Name, err)
+		}
+		files[header.Name] = data
+	}
+	return files, nil
+}
+
+// gitOpsManifestFile reports whether a file holds manifests
+func gitOpsManifestFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,503 @@
+// Package service provides conversion of Grafana dashboards into platform dashboards
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrGrafanaDashboardNotFound is returned when the synced Grafana dashboard does not exist
+	ErrGrafanaDashboardNotFound = errors.New("grafana dashboard not found")
+	// ErrInvalidGrafanaImport is returned when a Grafana dashboard cannot be imported as requested
+	ErrInvalidGrafanaImport = errors.New("invalid grafana import")
+)
+
+// defaultImportedRefreshRate is the refresh rate of dashboards that do not auto-refresh in Grafana
+const defaultImportedRefreshRate = 30
+
+// grafanaPanelTypes maps the Grafana panel types that plot query results to the
+// platform's; legacy types become their replacements
+var grafanaPanelTypes = map[string]string{
+	"timeseries":     "timeseries",
+	"graph":          "timeseries",
+	"stat":           "stat",
+	"singlestat":     "stat",
+	"gauge":          "gauge",
+	"bargauge":       "bargauge",
+	"table":          "table",
+	"table-old":      "table",
+	"heatmap":        "heatmap",
+	"piechart":       "piechart",
+	"barchart":       "barchart",
+	"histogram":      "histogram",
+	"state-timeline": "state-timeline",
+	"status-history": "status-history",
+}
+
+// grafanaDashboardJSON is the part of the Grafana dashboard model that is imported
+type grafanaDashboardJSON struct {
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Tags        []string        `json:"tags"`
+	Refresh     json.RawMessage `json:"refresh"` // A duration, or false
+	Panels      []grafanaPanel  `json:"panels"`
+	Rows        []struct {
+		Panels []grafanaPanel `json:"panels"`
+	} `json:"rows"` // Before schema version 16
+	Templating struct {
+		List []grafanaVariable `json:"list"`
+	} `json:"templating"`
+}
+
+type grafanaPanel struct {
+	ID              model.DashboardPanelID  `json:"id"`
+	Title           string                  `json:"title"`
+	Description     string                  `json:"description"`
+	Type            string                  `json:"type"`
+	GridPos         *model.DashboardGridPos `json:"gridPos"`
+	Datasource      json.RawMessage         `json:"datasource"`
+	Targets         []grafanaTarget         `json:"targets"`
+	Panels          []grafanaPanel          `json:"panels"` // Of a collapsed row
+	Repeat          string                  `json:"repeat"`
+	RepeatDirection string                  `json:"repeatDirection"`
+	LibraryPanel    json.RawMessage         `json:"libraryPanel"`
+}
+
+type grafanaTarget struct {
+	RefID        string          `json:"refId"`
+	Expr         string          `json:"expr"`
+	LegendFormat string          `json:"legendFormat"`
+	Hide         bool            `json:"hide"`
+	Datasource   json.RawMessage `json:"datasource"`
+}
+
+type grafanaVariable struct {
+	Name       string          `json:"name"`
+	Label      string          `json:"label"`
+	Type       string          `json:"type"`
+	Query      json.RawMessage `json:"query"` // A string, or an object holding it
+	Multi      bool            `json:"multi"`
+	IncludeAll bool            `json:"includeAll"`
+	AllValue   string          `json:"allValue"`
+	Regex      string          `json:"regex"`
+	Current    struct {
+		Value json.RawMessage `json:"value"` // A string, or a list for several values
+	} `json:"current"`
+	Options []struct {
+		Value string `json:"value"`
+	} `json:"options"`
+}
+
+// grafanaDataSourceRef is a panel's or target's data source, given by name or by uid and type
+type grafanaDataSourceRef struct {
+	UID  string `json:"uid"`
+	Type string `json:"type"`
+	name string
+}
+
+// GrafanaImportService converts synced Grafana dashboards into Prometheus dashboards
+type GrafanaImportService struct {
+	db *gorm.DB
+}
+
+// NewGrafanaImportService creates a new Grafana import service
+func NewGrafanaImportService(db *gorm.DB) *GrafanaImportService {
+	return &GrafanaImportService{db: db}
+}
+
+// grafanaConverter holds what converting one dashboard needs
+type grafanaConverter struct {
+	sources     []model.GrafanaDataSource
+	platform    []model.PrometheusDataSource
+	variables   map[string]bool // Names of datasource variables
+	result      *model.GrafanaImportResult
+	warnedLinks map[string]bool
+}
+
+// Import converts a synced Grafana dashboard of the user and, unless it is a dry
+// run, saves it as a Prometheus dashboard. Panels that plot Prometheus queries are
+// imported; the others are reported.
+func (s *GrafanaImportService) Import(userID, grafanaDashboardID uuid.UUID, req *model.ConvertGrafanaDashboardRequest) (*model.GrafanaImportResult, error) {
+	var source model.GrafanaDashboard
+	if err := s.db.Where("id = ? AND user_id = ?", grafanaDashboardID, userID).First(&source).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGrafanaDashboardNotFound
+		}
+		return nil, err
+	}
+	if req.DataSourceID != nil {
+		if err := s.db.Select("id").Where("id = ? AND user_id = ?", *req.DataSourceID, userID).First(&model.PrometheusDataSource{}).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: data source not found", ErrInvalidGrafanaImport)
+			}
+			return nil, err
+		}
+	}
+
+	dashboard, err := parseGrafanaDashboard(source.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	conv := &grafanaConverter{
+		variables:   make(map[string]bool),
+		warnedLinks: make(map[string]bool),
+		result: &model.GrafanaImportResult{
+			Config:      model.PrometheusDashboardConfig{DataSourceID: req.DataSourceID, Panels: []model.PrometheusDashboardPanel{}},
+			Unconverted: []model.GrafanaImportIssue{},
+			Warnings:    []string{},
+		},
+	}
+	if err := s.db.Where("instance_id = ?", source.InstanceID).Find(&conv.sources).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("user_id = ?", userID).Find(&conv.platform).Error; err != nil {
+		return nil, err
+	}
+	conv.convertVariables(dashboard.Templating.List)
+	for _, panel := range dashboard.Panels {
+		conv.convertPanel(panel)
+	}
+	for _, row := range dashboard.Rows {
+		for _, panel := range row.Panels {
+			conv.convertPanel(panel)
+		}
+	}
+	result := conv.result
+	result.PanelsImported = len(result.Config.Panels)
+	if req.DryRun {
+		return result, nil
+	}
+	if result.PanelsImported == 0 {
+		return nil, fmt.Errorf("%w: no panel could be converted", ErrInvalidGrafanaImport)
+	}
+
+	config, err := json.Marshal(result.Config)
+	if err != nil {
+		return nil, err
+	}
+	tags := "[]"
+	if len(dashboard.Tags) > 0 {
+		raw, _ := json.Marshal(dashboard.Tags)
+		tags = string(raw)
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = source.Title
+	}
+	clusterID := req.ClusterID
+	if clusterID == nil {
+		clusterID = source.ClusterID
+	}
+	imported := &model.PrometheusDashboard{
+		UserID:      userID,
+		ClusterID:   clusterID,
+		Name:        name,
+		Description: dashboard.Description,
+		Tags:        tags,
+		Config:      string(config),
+		IsPublic:    req.IsPublic,
+		RefreshRate: grafanaRefreshRate(dashboard.Refresh),
+	}
+	if err := s.db.Create(imported).Error; err != nil {
+		return nil, err
+	}
+	result.Dashboard = imported
+	return result, nil
+}
+
+// parseGrafanaDashboard reads a dashboard model, also when it is wrapped as
+// returned by Grafana's /api/dashboards/uid endpoint
+func parseGrafanaDashboard(config string) (*grafanaDashboardJSON, error) {
+	var wrapped struct {
+		Dashboard *grafanaDashboardJSON `json:"dashboard"`
+	}
+	if err := json.Unmarshal([]byte(config), &wrapped); err != nil {
+		return nil, fmt.Errorf("%w: dashboard JSON is invalid: %v", ErrInvalidGrafanaImport, err)
+	}
+	if wrapped.Dashboard != nil {
+		return wrapped.Dashboard, nil
+	}
+	var dashboard grafanaDashboardJSON
+	if err := json.Unmarshal([]byte(config), &dashboard); err != nil {
+		return nil, fmt.Errorf("%w: dashboard JSON is invalid: %v", ErrInvalidGrafanaImport, err)
+	}
+	return &dashboard, nil
+}
+
+// convertVariables maps the template variables that have a value without Grafana
+func (c *grafanaConverter) convertVariables(list []grafanaVariable) {
+	for _, v := range list {
+		variable := model.PrometheusDashboardVariable{
+			Name:       v.Name,
+			Label:      v.Label,
+			Type:       v.Type,
+			Query:      rawString(v.Query, "query"),
+			Current:    currentValue(v),
+			Multi:      v.Multi,
+			IncludeAll: v.IncludeAll,
+			AllValue:   v.AllValue,
+			Regex:      v.Regex,
+		}
+		for _, option := range v.Options {
+			if option.Value != model.DashboardVariableAll {
+				variable.Options = append(variable.Options, option.Value)
+			}
+		}
+
+		switch v.Type {
+		case "query":
+		case "custom", "interval":
+			if len(variable.Options) == 0 {
+				for _, option := range strings.Split(variable.Query, ",") {
+					if option = strings.TrimSpace(option); option != "" {
+						variable.Options = append(variable.Options, option)
+					}
+				}
+			}
+		case "constant", "textbox":
+			if variable.Current == "" {
+				variable.Current = variable.Query
+			}
+		case "datasource":
+			c.variables[v.Name] = true
+			c.warn(fmt.Sprintf("data source variable $%s is replaced by the bound data source", v.Name))
+			continue
+		default:
+			c.warn(fmt.Sprintf("variable $%s of type %q is not supported and was dropped", v.Name, v.Type))
+			continue
+		}
+		c.result.Config.Variables = append(c.result.Config.Variables, variable)
+	}
+}
+
+// currentValue returns a variable's current value, with several values as a regex
+// alternation and All as is
+func currentValue(v grafanaVariable) string {
+	var values []string
+	var single string
+	if err := json.Unmarshal(v.Current.Value, &single); err == nil {
+		values = []string{single}
+	} else {
+		_ = json.Unmarshal(v.Current.Value, &values)
+	}
+	for _, value := range values {
+		if value == model.DashboardVariableAll {
+			return model.DashboardVariableAll
+		}
+	}
+	return strings.Join(values, "|")
+}
+
+// convertPanel imports a panel, the panels of a collapsed row, or reports why it cannot be
+func (c *grafanaConverter) convertPanel(panel grafanaPanel) {
+	issue := func(reason string) {
+		c.result.Unconverted = append(c.result.Unconverted, model.GrafanaImportIssue{
+			PanelID: string(panel.ID),
+			Title:   panel.Title,
+			Type:    panel.Type,
+			Reason:  reason,
+		})
+	}
+
+	if panel.Type == "row" {
+		for _, child := range panel.Panels {
+			c.convertPanel(child)
+		}
+		return
+	}
+	if len(panel.LibraryPanel) > 0 && string(panel.LibraryPanel) != "null" {
+		issue("library panels are not expanded")
+		return
+	}
+	panelType, ok := grafanaPanelTypes[panel.Type]
+	if !ok {
+		if len(panel.Targets) == 0 {
+			issue("panel has no queries")
+		} else {
+			issue(fmt.Sprintf("panel type %q is not supported", panel.Type))
+		}
+		return
+	}
+
+	converted := model.PrometheusDashboardPanel{
+		ID:          panel.ID,
+		Title:       panel.Title,
+		Description: panel.Description,
+		Type:        panelType,
+		GridPos:     panel.GridPos,
+	}
+	var skipped []string
+	var bound *uuid.UUID
+	for _, target := range panel.Targets {
+		ref := parseDataSourceRef(target.Datasource)
+		if ref == nil || ref.UID == "-- Mixed --" || ref.name == "-- Mixed --" {
+			ref = parseDataSourceRef(panel.Datasource)
+		}
+		kind, ds := c.resolve(ref)
+		if kind != "prometheus" {
+			skipped = append(skipped, fmt.Sprintf("%s uses the %s data source", targetLabel(target), kind))
+			continue
+		}
+		if strings.TrimSpace(target.Expr) == "" {
+			skipped = append(skipped, fmt.Sprintf("%s has no PromQL expression", targetLabel(target)))
+			continue
+		}
+		if id := c.platformSource(ds); id != nil && bound == nil {
+			bound = id
+		}
+		converted.Targets = append(converted.Targets, model.PrometheusDashboardTarget{
+			RefID:        target.RefID,
+			Expr:         target.Expr,
+			LegendFormat: target.LegendFormat,
+			Hide:         target.Hide,
+		})
+	}
+	if len(converted.Targets) == 0 {
+		if len(skipped) == 0 {
+			issue("panel has no queries")
+		} else {
+			issue(strings.Join(skipped, "; "))
+		}
+		return
+	}
+	if len(skipped) > 0 {
+		c.warn(fmt.Sprintf("panel %q: dropped queries: %s", panel.Title, strings.Join(skipped, "; ")))
+	}
+	if panel.Repeat != "" {
+		if c.hasVariable(panel.Repeat) {
+			converted.Repeat = panel.Repeat
+			converted.RepeatDirection = panel.RepeatDirection
+		} else {
+			c.warn(fmt.Sprintf("panel %q repeats for $%s, which was not imported; it was imported once", panel.Title, panel.Repeat))
+		}
+	}
+	if bound != nil && (c.result.Config.DataSourceID == nil || *bound != *c.result.Config.DataSourceID) {
+		converted.DataSourceID = bound
+	}
+	c.result.Config.Panels = append(c.result.Config.Panels, converted)
+}
+
+// hasVariable reports whether a template variable was imported
+func (c *grafanaConverter) hasVariable(name string) bool {
+	for _, v := range c.result.Config.Variables {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the type of a referenced Grafana data source and its synced record.
+// Panels without a reference use the instance's default data source.
+func (c *grafanaConverter) resolve(ref *grafanaDataSourceRef) (string, *model.GrafanaDataSource) {
+	if ref != nil && ref.name != "" && strings.HasPrefix(ref.name, "$") {
+		if c.variables[strings.Trim(ref.name, "${}")] {
+			return "prometheus", nil
+		}
+	}
+	for i := range c.sources {
+		ds := &c.sources[i]
+		switch {
+		case ref == nil || (ref.UID == "" && ref.name == ""):
+			if !ds.IsDefault {
+				continue
+			}
+		case ref.UID != "":
+			if ds.GrafanaUID != ref.UID {
+				continue
+			}
+		case ds.Name != ref.name:
+			continue
+		}
+		return strings.ToLower(ds.Type), ds
+	}
+	if ref != nil && ref.Type != "" {
+		return strings.ToLower(ref.Type), nil
+	}
+	// Unknown data sources are most likely the Prometheus the dashboard was built for
+	return "prometheus", nil
+}
+
+// platformSource returns the user's Prometheus data source with the URL of a
+// Grafana data source
+func (c *grafanaConverter) platformSource(ds *model.GrafanaDataSource) *uuid.UUID {
+	if ds == nil || ds.URL == "" {
+		return nil
+	}
+	for i := range c.platform {
+		if strings.TrimRight(c.platform[i].URL, "/") == strings.TrimRight(ds.URL, "/") {
+			return &c.platform[i].ID
+		}
+	}
+	if !c.warnedLinks[ds.Name] {
+		c.warnedLinks[ds.Name] = true
+		c.warn(fmt.Sprintf("no Prometheus data source matches Grafana data source %q (%s); its panels use the dashboard's data source", ds.Name, ds.URL))
+	}
+	return nil
+}
+
+func (c *grafanaConverter) warn(message string) {
+	c.result.Warnings = append(c.result.Warnings, message)
+}
+
+// parseDataSourceRef reads a data source given by name or as {uid, type}
+func parseDataSourceRef(raw json.RawMessage) *grafanaDataSourceRef {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return &grafanaDataSourceRef{name: name}
+	}
+	var ref grafanaDataSourceRef
+	if err := json.Unmarshal(raw, &ref); err != nil {
+		return nil
+	}
+	if strings.HasPrefix(ref.UID, "$") {
+		ref.name, ref.UID = ref.UID, ""
+	}
+	return &ref
+}
+
+// rawString reads a JSON string, or the string held under key of a JSON object
+func rawString(raw json.RawMessage, key string) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err == nil {
+		_ = json.Unmarshal(obj[key], &s)
+	}
+	return s
+}
+
+// grafanaRefreshRate converts a Grafana refresh interval to seconds
+func grafanaRefreshRate(raw json.RawMessage) int {
+	var refresh string
+	if err := json.Unmarshal(raw, &refresh); err != nil || refresh == "" {
+		return defaultImportedRefreshRate
+	}
+	d, err := time.ParseDuration(refresh)
+	if err != nil || d < time.Second {
+		return defaultImportedRefreshRate
+	}
+	return int(d / time.Second)
+}
+
+// targetLabel identifies a Grafana target in the import report
+func targetLabel(target grafanaTarget) string {
+	if target.RefID != "" {
+		return "query " + target.RefID
+	}
+	return "a query"
+}
@@ -0,0 +1,411 @@
+// Package service provides liveness and readiness checks for the API gateway
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pkgdb "github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ErrHealthDegraded marks a failed check as degraded rather than down
+var ErrHealthDegraded = errors.New("degraded")
+
+// HealthCheckFunc checks one component. It returns details to report and an error
+// when the component is unhealthy; errors wrapping ErrHealthDegraded report the
+// component as degraded instead of down.
+type HealthCheckFunc func(ctx context.Context) (map[string]interface{}, error)
+
+type healthCheck struct {
+	name     string
+	critical bool
+	check    HealthCheckFunc
+}
+
+// HealthService runs the registered component checks. The service is ready while
+// every critical component is up; non-critical components only degrade it.
+type HealthService struct {
+	logger    *zap.Logger
+	timeout   time.Duration
+	startedAt time.Time
+	workers   *WorkerMonitor
+
+	mu           sync.RWMutex
+	checks       []healthCheck
+	shuttingDown bool
+}
+
+// NewHealthService creates a new health service. Each check is bounded by timeout.
+func NewHealthService(logger *zap.Logger, workers *WorkerMonitor, timeout time.Duration) *HealthService {
+	return &HealthService{
+		logger:    logger,
+		timeout:   timeout,
+		startedAt: time.Now(),
+		workers:   workers,
+	}
+}
+
+// Register adds a component check
+func (s *HealthService) Register(name string, critical bool, check HealthCheckFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = append(s.checks, healthCheck{name: name, critical: critical, check: check})
+}
+
+// SetShuttingDown makes readiness fail so load balancers stop routing to the
+// instance while it drains
+func (s *HealthService) SetShuttingDown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shuttingDown = true
+}
+
+// Live reports whether the process is alive: it is serving requests and none of its
+// background workers has crashed. It does not touch external dependencies.
+func (s *HealthService) Live(ctx context.Context) *model.HealthReport {
+	var components []model.ComponentHealth
+	if s.workers != nil {
+		components = append(components, s.run(ctx, healthCheck{name: "workers", critical: true, check: s.workers.HealthCheck}))
+	}
+	return s.report(components, false)
+}
+
+// Ready runs every registered check and reports whether the service can take traffic
+func (s *HealthService) Ready(ctx context.Context) *model.HealthReport {
+	s.mu.RLock()
+	checks := make([]healthCheck, len(s.checks))
+	copy(checks, s.checks)
+	shuttingDown := s.shuttingDown
+	s.mu.RUnlock()
+
+	if s.workers != nil {
+		checks = append(checks, healthCheck{name: "workers", critical: false, check: s.workers.HealthCheck})
+	}
+
+	components := make([]model.ComponentHealth, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check healthCheck) {
+			defer wg.Done()
+			components[i] = s.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	return s.report(components, shuttingDown)
+}
+
+// run executes one check within the service timeout
+func (s *HealthService) run(ctx context.Context, check healthCheck) model.ComponentHealth {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := check.check(ctx)
+	component := model.ComponentHealth{
+		Name:      check.name,
+		Status:    model.HealthStatusUp,
+		Critical:  check.critical,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Details:   details,
+	}
+	if err != nil {
+		component.Status = model.HealthStatusDown
+		if errors.Is(err, ErrHealthDegraded) {
+			component.Status = model.HealthStatusDegraded
+		}
+		component.Message = err.Error()
+		if ctx.Err() == context.DeadlineExceeded {
+			component.Message = fmt.Sprintf("check timed out after %s", s.timeout)
+		}
+		s.logger.Warn("health check failed",
+			zap.String("component", check.name),
+			zap.String("status", string(component.Status)),
+			zap.Error(err),
+		)
+	}
+	return component
+}
+
+func (s *HealthService) report(components []model.ComponentHealth, shuttingDown bool) *model.HealthReport {
+	status := model.HealthStatusUp
+	for _, c := range components {
+		switch {
+		case c.Status == model.HealthStatusDown && c.Critical:
+			status = model.HealthStatusDown
+		case c.Status != model.HealthStatusUp && status == model.HealthStatusUp:
+			status = model.HealthStatusDegraded
+		}
+	}
+	if shuttingDown {
+		status = model.HealthStatusDown
+		components = append(components, model.ComponentHealth{
+			Name:     "server",
+			Status:   model.HealthStatusDown,
+			Critical: true,
+			Message:  "shutting down",
+		})
+	}
+	if components == nil {
+		components = []model.ComponentHealth{}
+	}
+
+	return &model.HealthReport{
+		Status:     status,
+		CheckedAt:  time.Now().UTC(),
+		Uptime:     time.Since(s.startedAt).Round(time.Second).String(),
+		Components: components,
+	}
+}
+
+// ============== Component Checks ==============
+
+// DatabaseHealthCheck pings the database and reports its connection pool, and the
+// circuit breaker state when a guard is installed
+func DatabaseHealthCheck(db *gorm.DB) HealthCheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		if db == nil {
+			return nil, errors.New("database is not configured")
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+
+		details := map[string]interface{}{}
+		if guard := pkgdb.GuardOf(db); guard != nil {
+			details["breaker"] = guard.Stats()
+		}
+		if err := sqlDB.PingContext(ctx); err != nil {
+			return details, err
+		}
+
+		stats := sqlDB.Stats()
+		details["openConnections"] = stats.OpenConnections
+		details["inUse"] = stats.InUse
+		details["idle"] = stats.Idle
+		details["waitCount"] = stats.WaitCount
+		return details, nil
+	}
+}
+
+// MigrationsHealthCheck compares the schema version recorded by golang-migrate with
+// the newest migration in dir. A dirty or outdated schema is down; a schema newer
+// than this build, or a missing migrations directory, is degraded.
+func MigrationsHealthCheck(db *gorm.DB, dir string) HealthCheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		if db == nil {
+			return nil, errors.New("database is not configured")
+		}
+
+		var (
+			applied uint64
+			dirty   bool
+		)
+		row := db.WithContext(ctx).Raw("SELECT version, dirty FROM schema_migrations LIMIT 1").Row()
+		if err := row.Scan(&applied, &dirty); err != nil {
+			return nil, fmt.Errorf("failed to read schema version: %w", err)
+		}
+
+		details := map[string]interface{}{
+			"appliedVersion": applied,
+			"dirty":          dirty,
+		}
+		if dirty {
+			return details, fmt.Errorf("migration %d is dirty", applied)
+		}
+
+		latest, err := latestMigrationVersion(dir)
+		if err != nil {
+			return details, fmt.Errorf("%w: %v", ErrHealthDegraded, err)
+		}
+		details["latestVersion"] = latest
+
+		switch {
+		case applied < latest:
+			return details, fmt.Errorf("schema version %d is behind latest migration %d", applied, latest)
+		case applied > latest:
+			return details, fmt.Errorf("%w: schema version %d is newer than latest migration %d", ErrHealthDegraded, applied, latest)
+		}
+		return details, nil
+	}
+}
+
+// latestMigrationVersion returns the highest version among the up migrations in dir
+func latestMigrationVersion(dir string) (uint64, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return 0, fmt.Errorf("migrations directory %s not found", dir)
+		}
+		return 0, fmt.Errorf("no migrations found in %s", dir)
+	}
+
+	var latest uint64
+	for _, file := range files {
+		prefix, _, _ := strings.Cut(filepath.Base(file), "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+// HTTPReachabilityCheck reports whether rawURL answers HTTP requests. Any response
+// counts as reachable, since dependencies often reject unauthenticated requests.
+func HTTPReachabilityCheck(rawURL string) HealthCheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrHealthDegraded, err)
+		}
+		resp.Body.Close()
+		return map[string]interface{}{
+			"statusCode": resp.StatusCode,
+		}, nil
+	}
+}
+
+// LDAPReachabilityCheck reports whether the LDAP server in rawURL accepts TCP
+// connections
+func LDAPReachabilityCheck(rawURL string) HealthCheckFunc {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		addr := u.Host
+		if u.Port() == "" {
+			port := "389"
+			if u.Scheme == "ldaps" {
+				port = "636"
+			}
+			addr = net.JoinHostPort(u.Hostname(), port)
+		}
+
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrHealthDegraded, err)
+		}
+		conn.Close()
+		return nil, nil
+	}
+}
+
+// ============== Background Workers ==============
+
+// WorkerState is the state of a background worker
+type WorkerState string
+
+const (
+	WorkerStateRunning WorkerState = "running"
+	WorkerStateStopped WorkerState = "stopped"
+	WorkerStateFailed  WorkerState = "failed"
+)
+
+// WorkerStatus is the last known status of a background worker
+type WorkerStatus struct {
+	State     WorkerState `json:"state"`
+	StartedAt time.Time   `json:"startedAt"`
+	StoppedAt *time.Time  `json:"stoppedAt,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// WorkerMonitor runs background workers and tracks whether they are still running
+type WorkerMonitor struct {
+	logger *zap.Logger
+
+	mu      sync.RWMutex
+	workers map[string]*WorkerStatus
+}
+
+// NewWorkerMonitor creates a new worker monitor
+func NewWorkerMonitor(logger *zap.Logger) *WorkerMonitor {
+	return &WorkerMonitor{
+		logger:  logger,
+		workers: make(map[string]*WorkerStatus),
+	}
+}
+
+// Go runs a worker in a goroutine. A worker that panics, or returns before ctx is
+// cancelled, is recorded as failed.
+func (m *WorkerMonitor) Go(ctx context.Context, name string, run func(ctx context.Context)) {
+	m.mu.Lock()
+	m.workers[name] = &WorkerStatus{State: WorkerStateRunning, StartedAt: time.Now().UTC()}
+	m.mu.Unlock()
+
+	go func() {
+		state, message := WorkerStateStopped, ""
+		defer func() {
+			if r := recover(); r != nil {
+				state, message = WorkerStateFailed, fmt.Sprintf("panic: %v", r)
+				m.logger.Error("background worker panicked", zap.String("worker", name), zap.Any("panic", r))
+			}
+			m.finish(name, state, message)
+		}()
+
+		run(ctx)
+		if ctx.Err() == nil {
+			state, message = WorkerStateFailed, "exited unexpectedly"
+			m.logger.Error("background worker exited unexpectedly", zap.String("worker", name))
+		}
+	}()
+}
+
+func (m *WorkerMonitor) finish(name string, state WorkerState, message string) {
+	now := time.Now().UTC()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if status, ok := m.workers[name]; ok {
+		status.State = state
+		status.StoppedAt = &now
+		status.Error = message
+	}
+}
+
+// HealthCheck reports the status of every worker and fails if any has failed
+func (m *WorkerMonitor) HealthCheck(ctx context.Context) (map[string]interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	details := make(map[string]interface{}, len(m.workers))
+	var failed []string
+	for name, status := range m.workers {
+		details[name] = *status
+		if status.State == WorkerStateFailed {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return details, fmt.Errorf("workers failed: %s", strings.Join(failed, ", "))
+	}
+	return details, nil
+}
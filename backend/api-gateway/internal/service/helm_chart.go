@@ -0,0 +1,431 @@
+// Package service provides the loading of Helm charts from the HTTP chart
+// repositories users register
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const (
+	// helmChartTimeout bounds one request to a chart repository
+	helmChartTimeout = 30 * time.Second
+	// helmChartMaxIndex caps the repository index read
+	helmChartMaxIndex = 32 << 20
+	// helmChartMaxArchive caps a chart archive, compressed and unpacked
+	helmChartMaxArchive = 16 << 20
+	helmChartMaxFiles   = 64 << 20
+	// helmChartMaxDepth caps the nesting of subcharts
+	helmChartMaxDepth = 5
+)
+
+var (
+	// ErrHelmChartUnavailable is returned when a chart cannot be fetched from its repository
+	ErrHelmChartUnavailable = errors.New("helm chart unavailable")
+	// errHelmChartUnregistered is returned for chart references that name none of the user's repositories
+	errHelmChartUnregistered = errors.New("chart is not from a registered repository")
+)
+
+// helmChart is a chart as the platform renders it
+type helmChart struct {
+	Metadata  helmChartMetadata
+	Values    map[string]interface{} // values.yaml
+	Schema    []byte                 // values.schema.json, if any
+	Templates map[string]string      // By path in the chart, e.g. templates/service.yaml
+	Files     map[string][]byte      // Other files, available to templates as .Files
+	Charts    []*helmChart           // Subcharts
+}
+
+// helmChartMetadata is the part of Chart.yaml the platform reads
+type helmChartMetadata struct {
+	Name         string                `yaml:"name"`
+	Version      string                `yaml:"version"`
+	AppVersion   string                `yaml:"appVersion"`
+	Description  string                `yaml:"description"`
+	Type         string                `yaml:"type"`
+	KubeVersion  string                `yaml:"kubeVersion"`
+	Dependencies []helmChartDependency `yaml:"dependencies"`
+}
+
+// helmChartDependency is a subchart as Chart.yaml declares it
+type helmChartDependency struct {
+	Name      string `yaml:"name"`
+	Alias     string `yaml:"alias"`
+	Condition string `yaml:"condition"`
+}
+
+// helmRepoIndex is the part of a repository's index.yaml the platform reads
+type helmRepoIndex struct {
+	Entries map[string][]struct {
+		Version string   `yaml:"version"`
+		URLs    []string `yaml:"urls"`
+	} `yaml:"entries"`
+}
+
+// fetchChart downloads a version of a chart, referenced as repository/chart,
+// from the user's repository of that name; the latest stable version when
+// version is empty. OCI repositories are not supported yet.
+func (s *HelmReleaseService) fetchChart(ctx context.Context, userID uuid.UUID, ref, version string) (*helmChart, error) {
+	repoName, chartName, ok := strings.Cut(ref, "/")
+	if !ok || repoName == "" || chartName == "" {
+		return nil, errHelmChartUnregistered
+	}
+	var repo model.HelmRepository
+	if err := s.db.Where("user_id = ? AND name = ?", userID, repoName).First(&repo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errHelmChartUnregistered
+		}
+		return nil, err
+	}
+	if repo.Type == model.HelmRepoTypeOCI {
+		return nil, fmt.Errorf("%w: charts of OCI repositories cannot be fetched yet", ErrHelmChartUnavailable)
+	}
+
+	client, err := helmRepoClient(&repo)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHelmChartUnavailable, err)
+	}
+	base, err := url.Parse(strings.TrimSuffix(repo.URL, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid repository URL", ErrHelmChartUnavailable)
+	}
+
+	data, err := helmRepoGet(ctx, client, &repo, base.ResolveReference(&url.URL{Path: "index.yaml"}).String(), helmChartMaxIndex)
+	if err != nil {
+		return nil, err
+	}
+	var index helmRepoIndex
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("%w: invalid index of repository %s", ErrHelmChartUnavailable, repo.Name)
+	}
+
+	var archiveURL, found string
+	for _, entry := range index.Entries[chartName] {
+		if len(entry.URLs) == 0 {
+			continue
+		}
+		if version != "" {
+			if strings.TrimPrefix(entry.Version, "v") == strings.TrimPrefix(version, "v") {
+				archiveURL, found = entry.URLs[0], entry.Version
+				break
+			}
+			continue
+		}
+		if v, ok := parseSemver(entry.Version); ok && v.pre == "" {
+			if latest, _ := parseSemver(found); found == "" || compareSemver(v, latest) > 0 {
+				archiveURL, found = entry.URLs[0], entry.Version
+			}
+		}
+	}
+	if archiveURL == "" {
+		if version != "" {
+			return nil, fmt.Errorf("%w: version %s of chart %s not found in repository %s", ErrHelmChartUnavailable, version, chartName, repo.Name)
+		}
+		return nil, fmt.Errorf("%w: chart %s not found in repository %s", ErrHelmChartUnavailable, chartName, repo.Name)
+	}
+	archive, err := url.Parse(archiveURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid URL of chart %s", ErrHelmChartUnavailable, chartName)
+	}
+
+	data, err = helmRepoGet(ctx, client, &repo, base.ResolveReference(archive).String(), helmChartMaxArchive)
+	if err != nil {
+		return nil, err
+	}
+	chart, err := loadChartArchive(data, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHelmChartUnavailable, err)
+	}
+	return chart, nil
+}
+
+// helmRepoClient returns an HTTP client with the repository's TLS settings
+func helmRepoClient(repo *model.HelmRepository) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: repo.InsecureSkipTLS}
+	if repo.CAFile != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(repo.CAFile)) {
+			return nil, fmt.Errorf("invalid CA certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if repo.CertFile != "" && repo.KeyFile != "" {
+		cert, err := tls.X509KeyPair([]byte(repo.CertFile), []byte(repo.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{
+		Timeout: helmChartTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}, nil
+}
+
+// helmRepoGet reads a file of the repository, at most limit bytes of it
+func helmRepoGet(ctx context.Context, client *http.Client, repo *model.HelmRepository, target string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHelmChartUnavailable, err)
+	}
+	if repo.Username != "" {
+		req.SetBasicAuth(repo.Username, repo.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHelmChartUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: repository %s answered %s for %s", ErrHelmChartUnavailable, repo.Name, resp.Status, path.Base(req.URL.Path))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHelmChartUnavailable, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: %s of repository %s is larger than %d MiB", ErrHelmChartUnavailable, path.Base(req.URL.Path), repo.Name, limit>>20)
+	}
+	return data, nil
+}
+
+// loadChartArchive unpacks a packaged chart, a gzipped tarball of the chart's
+// directory
+func loadChartArchive(data []byte, depth int) (*helmChart, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid chart archive: %w", err)
+	}
+	defer reader.Close()
+
+	files := map[string][]byte{}
+	var total int64
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid chart archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Files are under the chart's directory, e.g. nginx/values.yaml
+		_, name, ok := strings.Cut(path.Clean(strings.TrimPrefix(header.Name, "/")), "/")
+		if !ok || strings.HasPrefix(name, "../") {
+			continue
+		}
+		total += header.Size
+		if total > helmChartMaxFiles {
+			return nil, fmt.Errorf("chart is larger than %d MiB unpacked", helmChartMaxFiles>>20)
+		}
+		content, err := io.ReadAll(io.LimitReader(archive, header.Size))
+		if err != nil {
+			return nil, fmt.Errorf("invalid chart archive: %w", err)
+		}
+		files[name] = content
+	}
+	return loadChartFiles(files, depth)
+}
+
+// loadChartFiles builds a chart from its files, by path in the chart
+func loadChartFiles(files map[string][]byte, depth int) (*helmChart, error) {
+	metadata, ok := files["Chart.yaml"]
+	if !ok {
+		return nil, fmt.Errorf("chart has no Chart.yaml")
+	}
+	chart := &helmChart{
+		Values:    map[string]interface{}{},
+		Templates: map[string]string{},
+		Files:     map[string][]byte{},
+	}
+	if err := yaml.Unmarshal(metadata, &chart.Metadata); err != nil || chart.Metadata.Name == "" {
+		return nil, fmt.Errorf("invalid Chart.yaml")
+	}
+	if values, ok := files["values.yaml"]; ok {
+		parsed, err := parseHelmValues(string(values))
+		if err != nil {
+			return nil, fmt.Errorf("invalid values.yaml of chart %s", chart.Metadata.Name)
+		}
+		chart.Values = parsed
+	}
+	if schema, ok := files["values.schema.json"]; ok {
+		if !json.Valid(schema) {
+			return nil, fmt.Errorf("invalid values.schema.json of chart %s", chart.Metadata.Name)
+		}
+		chart.Schema = schema
+	}
+
+	subcharts := map[string]map[string][]byte{}
+	for name, content := range files {
+		switch {
+		case name == "Chart.yaml" || name == "values.yaml" || name == "values.schema.json" || name == "Chart.lock":
+		case strings.HasPrefix(name, "templates/"):
+			chart.Templates[name] = string(content)
+		case strings.HasPrefix(name, "charts/"):
+			rest := strings.TrimPrefix(name, "charts/")
+			if dir, file, ok := strings.Cut(rest, "/"); ok {
+				if subcharts[dir] == nil {
+					subcharts[dir] = map[string][]byte{}
+				}
+				subcharts[dir][file] = content
+			} else if strings.HasSuffix(rest, ".tgz") {
+				if depth >= helmChartMaxDepth {
+					return nil, fmt.Errorf("subcharts are nested more than %d deep", helmChartMaxDepth)
+				}
+				sub, err := loadChartArchive(content, depth+1)
+				if err != nil {
+					return nil, fmt.Errorf("subchart %s: %w", rest, err)
+				}
+				chart.Charts = append(chart.Charts, sub)
+			}
+		default:
+			chart.Files[name] = content
+		}
+	}
+	for dir, subfiles := range subcharts {
+		if depth >= helmChartMaxDepth {
+			return nil, fmt.Errorf("subcharts are nested more than %d deep", helmChartMaxDepth)
+		}
+		sub, err := loadChartFiles(subfiles, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("subchart %s: %w", dir, err)
+		}
+		chart.Charts = append(chart.Charts, sub)
+	}
+	return chart, nil
+}
+
+// parseHelmValues parses a YAML values document into JSON-like values: maps
+// keyed by strings, slices, strings, bools, float64 and int numbers and nil
+func parseHelmValues(document string) (map[string]interface{}, error) {
+	var parsed interface{}
+	if err := yaml.Unmarshal([]byte(document), &parsed); err != nil {
+		return nil, err
+	}
+	if parsed == nil {
+		return map[string]interface{}{}, nil
+	}
+	values, ok := normalizeHelmValue(parsed).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("values must be a YAML mapping")
+	}
+	return values, nil
+}
+
+func normalizeHelmValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = normalizeHelmValue(child)
+		}
+		return v
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			converted[fmt.Sprint(key)] = normalizeHelmValue(child)
+		}
+		return converted
+	case []interface{}:
+		for i, child := range v {
+			v[i] = normalizeHelmValue(child)
+		}
+		return v
+	}
+	return value
+}
+
+// mergeHelmValues overlays values on a chart's defaults as Helm does: maps
+// merge, anything else replaces the default, and a null removes it
+func mergeHelmValues(defaults, values map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(defaults)+len(values))
+	for key, value := range defaults {
+		merged[key] = value
+	}
+	for key, value := range values {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		override, isMap := value.(map[string]interface{})
+		base, baseIsMap := merged[key].(map[string]interface{})
+		if isMap && baseIsMap {
+			merged[key] = mergeHelmValues(base, override)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// subchartValues returns the values a subchart is rendered with: its defaults
+// overlaid with the parent's values under its name, and the parent's globals
+func subchartValues(sub *helmChart, name string, parent map[string]interface{}) map[string]interface{} {
+	scoped, _ := parent[name].(map[string]interface{})
+	values := mergeHelmValues(sub.Values, scoped)
+	if globals, ok := parent["global"].(map[string]interface{}); ok {
+		own, _ := values["global"].(map[string]interface{})
+		values["global"] = mergeHelmValues(own, globals)
+	}
+	return values
+}
+
+// dependency returns how the chart declares a subchart: the name its values
+// are under and whether its condition enables it
+func (c *helmChart) dependency(sub *helmChart, values map[string]interface{}) (string, bool) {
+	for _, dep := range c.Metadata.Dependencies {
+		if dep.Name != sub.Metadata.Name {
+			continue
+		}
+		name := dep.Name
+		if dep.Alias != "" {
+			name = dep.Alias
+		}
+		for _, condition := range strings.Split(dep.Condition, ",") {
+			if condition = strings.TrimSpace(condition); condition == "" {
+				continue
+			}
+			if enabled, ok := lookupHelmValue(values, condition).(bool); ok {
+				return name, enabled
+			}
+		}
+		return name, true
+	}
+	return sub.Metadata.Name, true
+}
+
+// lookupHelmValue returns the value at a dotted path, nil when there is none
+func lookupHelmValue(values map[string]interface{}, dotted string) interface{} {
+	var current interface{} = values
+	for _, key := range strings.Split(dotted, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
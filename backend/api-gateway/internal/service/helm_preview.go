@@ -0,0 +1,457 @@
+// Package service provides the preview of Helm upgrades: the values are
+// validated against the chart's schema and the rendered manifests are diffed
+// against the deployed ones, object by object
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// helmPreviewTimeout bounds reading the deployed release from the cluster
+	helmPreviewTimeout = 20 * time.Second
+	// helmDiffContext is the unchanged lines shown around each change
+	helmDiffContext = 3
+	// helmDiffMaxLines caps the lines of an object diffed line by line; larger
+	// objects are shown replaced whole
+	helmDiffMaxLines = 2000
+	// helmDiffMaxBytes caps the diff of one object
+	helmDiffMaxBytes = 64 << 10
+)
+
+// helmDocumentSeparator splits a manifest into its YAML documents
+var helmDocumentSeparator = regexp.MustCompile(`(?m)^---[ \t]*(#.*)?$`)
+
+// helmObject is an object of a rendered manifest
+type helmObject struct {
+	apiVersion string
+	kind       string
+	namespace  string
+	name       string
+	content    map[string]interface{}
+}
+
+func (o *helmObject) key() string {
+	return o.kind + "/" + o.namespace + "/" + o.name
+}
+
+// Preview returns what upgrading the release with the requested chart version
+// and values would change, without recording anything. Empty ones keep the
+// release's, as for Upgrade.
+func (s *HelmReleaseService) Preview(ctx context.Context, userID, id uuid.UUID, req *model.UpdateHelmReleaseRequest) (*model.HelmReleasePreview, error) {
+	release, err := s.release(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	version, values := release.ChartVersion, release.Values
+	if v := strings.TrimSpace(req.ChartVersion); v != "" {
+		version = v
+	}
+	if req.Values != "" {
+		values = req.Values
+	}
+	changed, _, err := changedValues(release.Values, values)
+	if err != nil {
+		return nil, err
+	}
+	userValues, _ := parseHelmValues(values)
+
+	chart, err := s.fetchChart(ctx, userID, release.Chart, version)
+	if err != nil {
+		if errors.Is(err, errHelmChartUnregistered) {
+			return nil, fmt.Errorf("%w: chart %s is not from a registered repository", ErrInvalidHelmRelease, release.Chart)
+		}
+		return nil, err
+	}
+
+	preview := &model.HelmReleasePreview{
+		ReleaseID:        release.ID,
+		Revision:         release.Revision,
+		Chart:            release.Chart,
+		FromChartVersion: release.ChartVersion,
+		ChartVersion:     chart.Metadata.Version,
+		SchemaErrors:     validateChartValues(chart, mergeHelmValues(chart.Values, userValues), ""),
+		ChangedValues:    changed,
+		Changes:          []model.HelmManifestChange{},
+		Warnings:         []string{},
+	}
+	if preview.SchemaErrors == nil {
+		preview.SchemaErrors = []string{}
+	}
+
+	kubeVersion, deployed, err := s.deployedRelease(ctx, release)
+	if err != nil {
+		s.logger.Warn("Failed to read deployed Helm release", zap.String("release_id", release.ID.String()), zap.Error(err))
+		preview.Warnings = append(preview.Warnings, "The deployed release could not be read from the cluster: "+err.Error())
+	}
+	if chart.Metadata.KubeVersion != "" && kubeVersion != "" {
+		if ok, err := helmSemverCompare(chart.Metadata.KubeVersion, kubeVersion); err == nil && !ok {
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("Chart %s %s requires Kubernetes %s; the cluster runs %s", chart.Metadata.Name, chart.Metadata.Version, chart.Metadata.KubeVersion, kubeVersion))
+		}
+	}
+
+	renderRelease := helmRenderRelease{Name: release.Name, Namespace: release.Namespace, Revision: int(release.Revision) + 1, IsUpgrade: true}
+	manifests, err := renderHelmChart(chart, userValues, renderRelease, kubeVersion)
+	if err != nil {
+		preview.RenderError = err.Error()
+		return preview, nil
+	}
+	after, err := helmManifestObjects(manifests)
+	if err != nil {
+		preview.RenderError = err.Error()
+		return preview, nil
+	}
+	preview.Valid = len(preview.SchemaErrors) == 0
+
+	var before []*helmObject
+	switch {
+	case deployed != nil:
+		preview.Baseline = model.HelmPreviewBaselineCluster
+		preview.Revision = deployed.Revision
+		before, err = helmManifestObjects(map[string]string{"manifest": deployed.Manifest})
+	default:
+		preview.Baseline = model.HelmPreviewBaselineRevision
+		before, err = s.renderRevision(ctx, userID, release, kubeVersion)
+	}
+	if err != nil {
+		preview.Baseline = model.HelmPreviewBaselineNone
+		preview.Warnings = append(preview.Warnings, "The current release could not be rendered; every object is shown as added: "+err.Error())
+		before = nil
+	}
+
+	preview.Changes, preview.Unchanged = diffHelmObjects(before, after)
+	return preview, nil
+}
+
+// deployedRelease returns the cluster's Kubernetes version and the manifest
+// Helm deployed for the release, nil when Helm has not deployed it
+func (s *HelmReleaseService) deployedRelease(ctx context.Context, release *model.HelmRelease) (string, *k8s.HelmReleaseManifest, error) {
+	var cluster model.K8sCluster
+	if err := s.db.First(&cluster, "id = ?", release.ClusterID).Error; err != nil {
+		return "", nil, fmt.Errorf("cluster not found")
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return "", nil, err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, helmPreviewTimeout)
+	defer cancel()
+
+	version, err := client.ServerVersion()
+	if err != nil {
+		return "", nil, err
+	}
+	deployed, err := client.GetHelmReleaseManifest(ctx, release.Namespace, release.Name)
+	if err != nil {
+		return version, nil, err
+	}
+	return version, deployed, nil
+}
+
+// renderRevision renders the release's current revision, for clusters without
+// a deployed manifest
+func (s *HelmReleaseService) renderRevision(ctx context.Context, userID uuid.UUID, release *model.HelmRelease, kubeVersion string) ([]*helmObject, error) {
+	chart, err := s.fetchChart(ctx, userID, release.Chart, release.ChartVersion)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseHelmValues(release.Values)
+	if err != nil {
+		return nil, fmt.Errorf("stored values are not a YAML mapping")
+	}
+	renderRelease := helmRenderRelease{Name: release.Name, Namespace: release.Namespace, Revision: int(release.Revision), IsInstall: release.Revision == 1, IsUpgrade: release.Revision > 1}
+	manifests, err := renderHelmChart(chart, values, renderRelease, kubeVersion)
+	if err != nil {
+		return nil, err
+	}
+	return helmManifestObjects(manifests)
+}
+
+// helmManifestObjects splits manifests into their objects, skipping empty
+// documents. Objects must have a kind and a name.
+func helmManifestObjects(manifests map[string]string) ([]*helmObject, error) {
+	names := make([]string, 0, len(manifests))
+	for name := range manifests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var objects []*helmObject
+	for _, name := range names {
+		for _, document := range helmDocumentSeparator.Split(manifests[name], -1) {
+			var parsed interface{}
+			if err := yaml.Unmarshal([]byte(document), &parsed); err != nil {
+				return nil, fmt.Errorf("%s: invalid YAML: %v", name, err)
+			}
+			if parsed == nil {
+				continue
+			}
+			content, ok := normalizeHelmValue(parsed).(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: a document is not a Kubernetes object", name)
+			}
+			object := &helmObject{content: content}
+			object.apiVersion, _ = content["apiVersion"].(string)
+			object.kind, _ = content["kind"].(string)
+			if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+				object.name = helmToString(metadata["name"])
+				object.namespace = helmToString(metadata["namespace"])
+			}
+			if object.kind == "" || object.name == "" {
+				return nil, fmt.Errorf("%s: an object has no kind or name", name)
+			}
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+// diffHelmObjects pairs the objects of two manifests by kind, namespace and
+// name and returns those that differ, ordered by kind and name, with the count
+// of those that do not
+func diffHelmObjects(before, after []*helmObject) ([]model.HelmManifestChange, int) {
+	previous := make(map[string]*helmObject, len(before))
+	for _, object := range before {
+		previous[object.key()] = object
+	}
+
+	changes := []model.HelmManifestChange{}
+	unchanged := 0
+	seen := make(map[string]bool, len(after))
+	for _, object := range after {
+		key := object.key()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		old := previous[key]
+		redactSecretData(old, object)
+		newYAML := helmToYAML(object.content)
+		if old == nil {
+			changes = append(changes, helmManifestChange(model.HelmManifestAdded, object, "", newYAML))
+			continue
+		}
+		oldYAML := helmToYAML(old.content)
+		if oldYAML == newYAML {
+			unchanged++
+			continue
+		}
+		changes = append(changes, helmManifestChange(model.HelmManifestChanged, object, oldYAML, newYAML))
+	}
+	for _, object := range before {
+		if key := object.key(); !seen[key] {
+			seen[key] = true
+			redactSecretData(object, nil)
+			changes = append(changes, helmManifestChange(model.HelmManifestRemoved, object, helmToYAML(object.content), ""))
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind < changes[j].Kind
+		}
+		if changes[i].Namespace != changes[j].Namespace {
+			return changes[i].Namespace < changes[j].Namespace
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes, unchanged
+}
+
+func helmManifestChange(action string, object *helmObject, before, after string) model.HelmManifestChange {
+	return model.HelmManifestChange{
+		Action:     action,
+		APIVersion: object.apiVersion,
+		Kind:       object.kind,
+		Namespace:  object.namespace,
+		Name:       object.name,
+		Diff:       unifiedDiff(before, after),
+	}
+}
+
+// redactSecretData replaces the values of secrets before diffing them. Keys
+// whose value differs between the two are marked changed, so the diff shows
+// what changes without showing the values.
+func redactSecretData(before, after *helmObject) {
+	for _, field := range []string{"data", "stringData"} {
+		var old, current map[string]interface{}
+		if before != nil && before.kind == "Secret" {
+			old, _ = before.content[field].(map[string]interface{})
+		}
+		if after != nil && after.kind == "Secret" {
+			current, _ = after.content[field].(map[string]interface{})
+		}
+		for key, value := range current {
+			if previous, ok := old[key]; ok && helmToString(previous) != helmToString(value) {
+				current[key] = "(redacted, changed)"
+			} else {
+				current[key] = "(redacted)"
+			}
+		}
+		for key := range old {
+			old[key] = "(redacted)"
+		}
+	}
+}
+
+// unifiedDiff returns the unified diff of two texts, with helmDiffContext
+// lines of context around each change
+func unifiedDiff(before, after string) string {
+	a, b := diffLines(before), diffLines(after)
+
+	// Lines the texts start and end with are left out of the comparison
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	// Each line of both texts as kept, removed or added
+	type diffLine struct {
+		op   byte
+		text string
+		a, b int // Line numbers, from 1
+	}
+	var lines []diffLine
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, diffLine{' ', a[i], i + 1, i + 1})
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	for _, edit := range diffEdits(midA, midB) {
+		i, j := prefix+edit.a, prefix+edit.b
+		switch edit.op {
+		case ' ':
+			lines = append(lines, diffLine{' ', a[i], i + 1, j + 1})
+		case '-':
+			lines = append(lines, diffLine{'-', a[i], i + 1, j + 1})
+		case '+':
+			lines = append(lines, diffLine{'+', b[j], i + 1, j + 1})
+		}
+	}
+	for k := 0; k < suffix; k++ {
+		i, j := len(a)-suffix+k, len(b)-suffix+k
+		lines = append(lines, diffLine{' ', a[i], i + 1, j + 1})
+	}
+
+	// Group the changes into hunks with their context
+	var out strings.Builder
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			start++
+			continue
+		}
+		from := max(start-helmDiffContext, 0)
+		end := start
+		for k := start; k < len(lines) && k-end <= 2*helmDiffContext; k++ {
+			if lines[k].op != ' ' {
+				end = k
+			}
+		}
+		to := min(end+helmDiffContext+1, len(lines))
+
+		countA, countB := 0, 0
+		for _, line := range lines[from:to] {
+			if line.op != '+' {
+				countA++
+			}
+			if line.op != '-' {
+				countB++
+			}
+		}
+		startA, startB := lines[from].a, lines[from].b
+		if countA == 0 {
+			startA--
+		}
+		if countB == 0 {
+			startB--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", startA, countA, startB, countB)
+		for _, line := range lines[from:to] {
+			out.WriteByte(line.op)
+			out.WriteString(line.text)
+			out.WriteByte('\n')
+		}
+		if out.Len() > helmDiffMaxBytes {
+			return out.String()[:helmDiffMaxBytes] + "\n... (diff truncated)\n"
+		}
+		start = to
+	}
+	return out.String()
+}
+
+func diffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffEdit keeps, removes or adds the line at a of the old and b of the new text
+type diffEdit struct {
+	op   byte
+	a, b int
+}
+
+// diffEdits returns the edits turning a into b, keeping their longest common
+// subsequence of lines. Texts longer than helmDiffMaxLines are replaced whole.
+func diffEdits(a, b []string) []diffEdit {
+	var edits []diffEdit
+	if len(a) > helmDiffMaxLines || len(b) > helmDiffMaxLines {
+		for i := range a {
+			edits = append(edits, diffEdit{'-', i, 0})
+		}
+		for j := range b {
+			edits = append(edits, diffEdit{'+', len(a), j})
+		}
+		return edits
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, diffEdit{' ', i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, diffEdit{'-', i, j})
+			i++
+		default:
+			edits = append(edits, diffEdit{'+', i, j})
+			j++
+		}
+	}
+	return edits
+}
@@ -0,0 +1,468 @@
+// Package service provides the Helm release lifecycle: installs, upgrades and
+// rollbacks are recorded as revisions, published as platform events, annotated
+// on the dashboards of the release's cluster and optionally notified
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// maxChangedValues caps the values keys a release change lists
+const maxChangedValues = 50
+
+var (
+	// ErrInvalidHelmRelease is returned for installs, upgrades and rollbacks that are malformed
+	ErrInvalidHelmRelease = errors.New("invalid helm release")
+	// ErrHelmReleaseNotFound is returned when the release does not exist or belongs to another user
+	ErrHelmReleaseNotFound = errors.New("helm release not found")
+	// ErrHelmRevisionNotFound is returned when a rollback targets a revision that was not recorded
+	ErrHelmRevisionNotFound = errors.New("helm release revision not found")
+)
+
+// HelmReleaseService records changes to Helm releases and announces them
+type HelmReleaseService struct {
+	db            *gorm.DB
+	logger        *zap.Logger
+	annotations   *AnnotationService
+	events        *EventBus
+	notifications *NotificationService
+}
+
+// NewHelmReleaseService creates a new Helm release service. Changes are
+// annotated through annotations when it is set.
+func NewHelmReleaseService(db *gorm.DB, logger *zap.Logger, annotations *AnnotationService) *HelmReleaseService {
+	return &HelmReleaseService{
+		db:            db,
+		logger:        logger,
+		annotations:   annotations,
+		notifications: NewNotificationService(db, logger),
+	}
+}
+
+// SetEventBus sets the bus release changes are published on
+func (s *HelmReleaseService) SetEventBus(events *EventBus) {
+	s.events = events
+	s.notifications.SetEventBus(events)
+}
+
+// Install records a release of the chart in the user's cluster as its first
+// revision. Charts of registered repositories are fetched to validate the
+// values against their schema.
+func (s *HelmReleaseService) Install(ctx context.Context, userID uuid.UUID, changedBy string, req *model.CreateHelmReleaseRequest) (*model.HelmRelease, error) {
+	var cluster model.K8sCluster
+	if err := s.db.Where("id = ? AND user_id = ?", req.ClusterID, userID).First(&cluster).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrClusterNotFound
+		}
+		return nil, err
+	}
+
+	release := &model.HelmRelease{
+		ID:           uuid.New(),
+		UserID:       userID,
+		ClusterID:    req.ClusterID,
+		Namespace:    strings.TrimSpace(req.Namespace),
+		Name:         strings.TrimSpace(req.Name),
+		Revision:     1,
+		Status:       model.HelmReleaseStatusPending,
+		Chart:        strings.TrimSpace(req.Chart),
+		ChartVersion: strings.TrimSpace(req.ChartVersion),
+		Values:       req.Values,
+		Description:  req.Description,
+	}
+	if !kubernetesName.MatchString(release.Namespace) {
+		return nil, fmt.Errorf("%w: namespace must be a valid Kubernetes name", ErrInvalidHelmRelease)
+	}
+	if !kubernetesName.MatchString(release.Name) || len(release.Name) > 53 {
+		return nil, fmt.Errorf("%w: name must be a valid Kubernetes name of at most 53 characters", ErrInvalidHelmRelease)
+	}
+	if release.Chart == "" {
+		return nil, fmt.Errorf("%w: chart is required", ErrInvalidHelmRelease)
+	}
+	changed, cut, err := changedValues("", release.Values)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkValues(ctx, userID, release); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(release).Error; err != nil {
+			return err
+		}
+		return tx.Create(releaseRevision(release, model.HelmReleaseInstall, release.Description, changedBy)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.announce(&model.HelmReleaseChange{
+		Action:           model.HelmReleaseInstall,
+		Revision:         release.Revision,
+		ChartVersion:     release.ChartVersion,
+		ChangedValues:    changed,
+		ChangedValuesCut: cut,
+		ChangedBy:        changedBy,
+	}, release, req.Notify)
+	return release, nil
+}
+
+// Upgrade records a new revision of the release with the requested chart
+// version and values; empty ones keep the release's. The values are validated
+// as for Install.
+func (s *HelmReleaseService) Upgrade(ctx context.Context, userID uuid.UUID, changedBy string, id uuid.UUID, req *model.UpdateHelmReleaseRequest) (*model.HelmRelease, error) {
+	release, err := s.release(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	before := *release
+
+	if version := strings.TrimSpace(req.ChartVersion); version != "" {
+		release.ChartVersion = version
+	}
+	if req.Values != "" {
+		release.Values = req.Values
+	}
+	changed, cut, err := changedValues(before.Values, release.Values)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkValues(ctx, userID, release); err != nil {
+		return nil, err
+	}
+	release.Revision++
+	release.Status = model.HelmReleaseStatusPendingUpgrade
+
+	description := fmt.Sprintf("Upgrade to %s %s", release.Chart, release.ChartVersion)
+	if err := s.save(&before, release, model.HelmReleaseUpgrade, description, changedBy); err != nil {
+		return nil, err
+	}
+
+	s.announce(&model.HelmReleaseChange{
+		Action:           model.HelmReleaseUpgrade,
+		FromRevision:     before.Revision,
+		Revision:         release.Revision,
+		FromChartVersion: before.ChartVersion,
+		ChartVersion:     release.ChartVersion,
+		ChangedValues:    changed,
+		ChangedValuesCut: cut,
+		ChangedBy:        changedBy,
+	}, release, req.Notify)
+	return release, nil
+}
+
+// Rollback records a new revision of the release with the chart version and
+// values of an earlier one, the previous revision when req.Revision is 0
+func (s *HelmReleaseService) Rollback(userID uuid.UUID, changedBy string, id uuid.UUID, req *model.RollbackHelmReleaseRequest) (*model.HelmRelease, error) {
+	release, err := s.release(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	before := *release
+
+	target := req.Revision
+	if target == 0 {
+		target = release.Revision - 1
+	}
+	if target < 1 || target >= release.Revision {
+		return nil, fmt.Errorf("%w: revision must be an earlier revision of the release", ErrInvalidHelmRelease)
+	}
+	var revision model.HelmReleaseRevision
+	if err := s.db.Where("release_id = ? AND revision = ?", release.ID, target).First(&revision).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrHelmRevisionNotFound
+		}
+		return nil, err
+	}
+
+	release.ChartVersion = revision.ChartVersion
+	release.AppVersion = revision.AppVersion
+	release.Values = revision.Values
+	changed, cut, _ := changedValues(before.Values, release.Values)
+	release.Revision++
+	release.Status = model.HelmReleaseStatusPendingRollback
+
+	description := fmt.Sprintf("Rollback to %d", target)
+	if err := s.save(&before, release, model.HelmReleaseRollback, description, changedBy); err != nil {
+		return nil, err
+	}
+
+	s.announce(&model.HelmReleaseChange{
+		Action:           model.HelmReleaseRollback,
+		FromRevision:     before.Revision,
+		Revision:         release.Revision,
+		FromChartVersion: before.ChartVersion,
+		ChartVersion:     release.ChartVersion,
+		ChangedValues:    changed,
+		ChangedValuesCut: cut,
+		ChangedBy:        changedBy,
+	}, release, req.Notify)
+	return release, nil
+}
+
+// History lists the revisions of the release, newest first. Releases deployed
+// before revisions were recorded list only their current revision.
+func (s *HelmReleaseService) History(userID, id uuid.UUID) ([]model.HelmReleaseHistory, error) {
+	release, err := s.release(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []model.HelmReleaseRevision
+	if err := s.db.Where("release_id = ?", release.ID).Order("revision DESC").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return []model.HelmReleaseHistory{{
+			Revision:     release.Revision,
+			Updated:      release.Updated,
+			Status:       release.Status,
+			Chart:        release.Chart,
+			ChartVersion: release.ChartVersion,
+			AppVersion:   release.AppVersion,
+			Description:  release.Description,
+		}}, nil
+	}
+
+	history := make([]model.HelmReleaseHistory, 0, len(revisions))
+	for _, revision := range revisions {
+		status := model.HelmReleaseStatusSuperseded
+		if revision.Revision == release.Revision {
+			status = release.Status
+		}
+		history = append(history, model.HelmReleaseHistory{
+			Revision:     revision.Revision,
+			Updated:      revision.CreatedAt.UTC().Format(time.RFC3339),
+			Status:       status,
+			Chart:        revision.Chart,
+			ChartVersion: revision.ChartVersion,
+			AppVersion:   revision.AppVersion,
+			Description:  revision.Description,
+		})
+	}
+	return history, nil
+}
+
+// checkValues validates the release's values against the schemas of its chart
+// and fills in the chart's version and app version. Charts that are not from
+// one of the user's repositories are not checked.
+func (s *HelmReleaseService) checkValues(ctx context.Context, userID uuid.UUID, release *model.HelmRelease) error {
+	chart, err := s.fetchChart(ctx, userID, release.Chart, release.ChartVersion)
+	if errors.Is(err, errHelmChartUnregistered) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	values, err := parseHelmValues(release.Values)
+	if err != nil {
+		return fmt.Errorf("%w: values must be a YAML mapping", ErrInvalidHelmRelease)
+	}
+	if violations := validateChartValues(chart, mergeHelmValues(chart.Values, values), ""); len(violations) > 0 {
+		return fmt.Errorf("%w: values do not match the chart's schema: %s", ErrInvalidHelmRelease, strings.Join(violations, "; "))
+	}
+	release.ChartVersion = chart.Metadata.Version
+	release.AppVersion = chart.Metadata.AppVersion
+	return nil
+}
+
+// release gets a release of the user
+func (s *HelmReleaseService) release(userID, id uuid.UUID) (*model.HelmRelease, error) {
+	var release model.HelmRelease
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&release).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrHelmReleaseNotFound
+		}
+		return nil, err
+	}
+	return &release, nil
+}
+
+// save stores the release as its new revision. The revision it replaces is
+// recorded first if it was not, as for releases deployed before revisions were
+// kept or installed by other modules, so it can be rolled back to.
+func (s *HelmReleaseService) save(before, release *model.HelmRelease, action model.HelmReleaseAction, description, changedBy string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		previous := releaseRevision(before, model.HelmReleaseInstall, before.Description, "")
+		err := tx.Where("release_id = ? AND revision = ?", before.ID, before.Revision).
+			Attrs(previous).FirstOrCreate(&model.HelmReleaseRevision{}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Save(release).Error; err != nil {
+			return err
+		}
+		return tx.Create(releaseRevision(release, action, description, changedBy)).Error
+	})
+}
+
+func releaseRevision(release *model.HelmRelease, action model.HelmReleaseAction, description, changedBy string) *model.HelmReleaseRevision {
+	return &model.HelmReleaseRevision{
+		ReleaseID:    release.ID,
+		Revision:     release.Revision,
+		Action:       action,
+		Chart:        release.Chart,
+		ChartVersion: release.ChartVersion,
+		AppVersion:   release.AppVersion,
+		Values:       release.Values,
+		Description:  description,
+		CreatedBy:    changedBy,
+	}
+}
+
+// announce publishes the change, annotates it on the dashboards of the
+// release's cluster and, when notify is set, sends it to the user's
+// notification channels. Failures are logged; the change has been recorded.
+func (s *HelmReleaseService) announce(change *model.HelmReleaseChange, release *model.HelmRelease, notify bool) {
+	change.ReleaseID = release.ID
+	change.ClusterID = release.ClusterID
+	change.Namespace = release.Namespace
+	change.Name = release.Name
+	change.Chart = release.Chart
+
+	eventType := model.EventHelmReleaseInstalled
+	switch change.Action {
+	case model.HelmReleaseUpgrade:
+		eventType = model.EventHelmReleaseUpgraded
+	case model.HelmReleaseRollback:
+		eventType = model.EventHelmReleaseRolledBack
+	}
+	s.events.Publish(release.UserID, eventType, map[string]string{
+		"releaseId": release.ID.String(),
+		"clusterId": release.ClusterID.String(),
+		"namespace": release.Namespace,
+		"chart":     release.Chart,
+	}, change)
+
+	title, text := helmChangeSummary(change)
+	if s.annotations != nil {
+		clusterID := release.ClusterID
+		err := s.annotations.Record(&model.Annotation{
+			UserID:    release.UserID,
+			ClusterID: &clusterID,
+			Kind:      model.AnnotationDeployment,
+			Title:     title,
+			Text:      text,
+			Tags:      pq.StringArray{"helm", release.Name, string(change.Action)},
+			Source:    model.AnnotationSourceHelm,
+			SourceID:  release.ID.String(),
+			CreatedBy: change.ChangedBy,
+		})
+		if err != nil {
+			s.logger.Error("failed to annotate helm release change", zap.String("releaseId", release.ID.String()), zap.Error(err))
+		}
+	}
+
+	if notify {
+		if _, err := s.notifications.CreateSourcedNotification(release.UserID, model.NotificationSourceHelm, model.NotificationTypeInfo, title, text, model.NotificationPriorityLow); err != nil {
+			s.logger.Error("failed to notify helm release change", zap.String("releaseId", release.ID.String()), zap.Error(err))
+		}
+	}
+}
+
+// helmChangeSummary returns the title and text annotations and notifications
+// describe a release change with
+func helmChangeSummary(change *model.HelmReleaseChange) (string, string) {
+	var title string
+	switch change.Action {
+	case model.HelmReleaseUpgrade:
+		title = fmt.Sprintf("Upgraded %s to %s %s", change.Name, change.Chart, change.ChartVersion)
+	case model.HelmReleaseRollback:
+		title = fmt.Sprintf("Rolled back %s to %s %s", change.Name, change.Chart, change.ChartVersion)
+	default:
+		title = fmt.Sprintf("Installed %s (%s %s)", change.Name, change.Chart, change.ChartVersion)
+	}
+	if len(title) > 255 {
+		title = title[:255]
+	}
+
+	lines := []string{fmt.Sprintf("Release %s/%s, revision %d", change.Namespace, change.Name, change.Revision)}
+	if change.FromRevision != 0 {
+		lines[0] = fmt.Sprintf("Release %s/%s, revision %d to %d", change.Namespace, change.Name, change.FromRevision, change.Revision)
+	}
+	if change.FromChartVersion != change.ChartVersion && change.Action != model.HelmReleaseInstall {
+		lines = append(lines, fmt.Sprintf("Chart version: %s to %s", orNone(change.FromChartVersion), orNone(change.ChartVersion)))
+	}
+	switch {
+	case len(change.ChangedValues) == 0:
+		lines = append(lines, "Values changed: none")
+	case change.ChangedValuesCut:
+		lines = append(lines, fmt.Sprintf("Values changed: %s and more", strings.Join(change.ChangedValues, ", ")))
+	default:
+		lines = append(lines, "Values changed: "+strings.Join(change.ChangedValues, ", "))
+	}
+	if change.ChangedBy != "" {
+		lines = append(lines, "By "+change.ChangedBy)
+	}
+	return title, strings.Join(lines, "\n")
+}
+
+func orNone(version string) string {
+	if version == "" {
+		return "(none)"
+	}
+	return version
+}
+
+// changedValues lists the dotted paths of the values that differ between two
+// YAML values documents, at most maxChangedValues of them, and whether there
+// were more. Lists are compared whole. Only after has to parse; values that
+// were stored unparseable count as empty.
+func changedValues(before, after string) ([]string, bool, error) {
+	parsed, err := parseHelmValues(after)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: values must be a YAML mapping", ErrInvalidHelmRelease)
+	}
+	afterValues := map[string]string{}
+	flattenValues("", parsed, afterValues)
+
+	beforeValues := map[string]string{}
+	if parsed, err := parseHelmValues(before); err == nil {
+		flattenValues("", parsed, beforeValues)
+	}
+
+	changed := []string{}
+	for key, value := range afterValues {
+		if previous, ok := beforeValues[key]; !ok || previous != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range beforeValues {
+		if _, ok := afterValues[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	if len(changed) > maxChangedValues {
+		return changed[:maxChangedValues], true, nil
+	}
+	return changed, false, nil
+}
+
+// flattenValues adds the leaves of a values tree to out under their dotted paths
+func flattenValues(prefix string, value interface{}, out map[string]string) {
+	if values, ok := value.(map[string]interface{}); ok && len(values) > 0 {
+		for key, child := range values {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenValues(key, child, out)
+		}
+		return
+	}
+	if prefix != "" {
+		out[prefix] = fmt.Sprintf("%#v", value)
+	}
+}
@@ -0,0 +1,139 @@
+// Package service provides management of users' Helm chart repositories
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+var (
+	// ErrHelmRepoNotFound is returned when the user has no such repository
+	ErrHelmRepoNotFound = errors.New("repository not found")
+	// ErrHelmRepoExists is returned when the user already has a repository with the name
+	ErrHelmRepoExists = errors.New("repository name already exists")
+)
+
+// HelmRepoService manages the chart repositories Helm releases are installed from
+type HelmRepoService struct {
+	repos HelmRepoRepository
+}
+
+// NewHelmRepoService creates a new Helm repository service
+func NewHelmRepoService(repos HelmRepoRepository) *HelmRepoService {
+	return &HelmRepoService{repos: repos}
+}
+
+// Create adds a repository owned by userID
+func (s *HelmRepoService) Create(ctx context.Context, userID uuid.UUID, req *model.CreateHelmRepoRequest) (*model.HelmRepository, error) {
+	if err := s.checkName(ctx, userID, req.Name, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	repo := &model.HelmRepository{
+		ID:              uuid.New(),
+		UserID:          userID,
+		Name:            req.Name,
+		Description:     req.Description,
+		Type:            req.Type,
+		Status:          model.HelmRepoStatusActive,
+		URL:             req.URL,
+		Username:        req.Username,
+		Password:        req.Password, // Should be encrypted in production
+		CAFile:          req.CAFile,
+		CertFile:        req.CertFile,
+		KeyFile:         req.KeyFile,
+		InsecureSkipTLS: req.InsecureSkipTLS,
+	}
+	if err := s.repos.Create(ctx, repo); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// Get returns one of the user's repositories
+func (s *HelmRepoService) Get(ctx context.Context, id, userID uuid.UUID) (*model.HelmRepository, error) {
+	repo, err := s.repos.FindOwned(ctx, id, userID)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, ErrHelmRepoNotFound
+	}
+	return repo, err
+}
+
+// List returns a page of the user's repositories and how many match the filter
+func (s *HelmRepoService) List(ctx context.Context, filter *db.HelmRepoFilter) ([]model.HelmRepository, int64, error) {
+	return s.repos.List(ctx, filter)
+}
+
+// Update changes the non-empty fields of req; InsecureSkipTLS is always copied
+func (s *HelmRepoService) Update(ctx context.Context, id, userID uuid.UUID, req *model.UpdateHelmRepoRequest) (*model.HelmRepository, error) {
+	repo, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []string{"InsecureSkipTLS"}
+	if req.Name != "" {
+		if err := s.checkName(ctx, userID, req.Name, id); err != nil {
+			return nil, err
+		}
+		repo.Name = req.Name
+		fields = append(fields, "Name")
+	}
+	if req.Description != "" {
+		repo.Description = req.Description
+		fields = append(fields, "Description")
+	}
+	if req.URL != "" {
+		repo.URL = req.URL
+		fields = append(fields, "URL")
+	}
+	if req.Username != "" {
+		repo.Username = req.Username
+		fields = append(fields, "Username")
+	}
+	if req.Password != "" {
+		repo.Password = req.Password
+		fields = append(fields, "Password")
+	}
+	if req.CAFile != "" {
+		repo.CAFile = req.CAFile
+		fields = append(fields, "CAFile")
+	}
+	if req.CertFile != "" {
+		repo.CertFile = req.CertFile
+		fields = append(fields, "CertFile")
+	}
+	if req.KeyFile != "" {
+		repo.KeyFile = req.KeyFile
+		fields = append(fields, "KeyFile")
+	}
+	repo.InsecureSkipTLS = req.InsecureSkipTLS
+
+	if err := s.repos.Update(ctx, repo, fields...); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// Delete removes one of the user's repositories
+func (s *HelmRepoService) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	if _, err := s.Get(ctx, id, userID); err != nil {
+		return err
+	}
+	return s.repos.Delete(ctx, id)
+}
+
+func (s *HelmRepoService) checkName(ctx context.Context, userID uuid.UUID, name string, except uuid.UUID) error {
+	taken, err := s.repos.NameTaken(ctx, userID, name, except)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrHelmRepoExists
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+// Package service provides the validation of Helm values against the JSON
+// schemas charts ship as values.schema.json
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxSchemaErrors caps the violations reported for one chart
+	maxSchemaErrors = 50
+	// maxSchemaDepth caps the nesting of schemas and $refs followed
+	maxSchemaDepth = 64
+)
+
+// validateChartValues checks values against the schema of the chart and those
+// of its enabled subcharts, with the values each is rendered with. The paths
+// of the violations start at prefix.
+func validateChartValues(chart *helmChart, values map[string]interface{}, prefix string) []string {
+	var violations []string
+	if chart.Schema != nil {
+		violations = validateValuesSchema(chart.Schema, values, prefix)
+	}
+	for _, sub := range chart.Charts {
+		name, enabled := chart.dependency(sub, values)
+		if enabled {
+			violations = append(violations, validateChartValues(sub, subchartValues(sub, name, values), schemaPath(prefix, name))...)
+		}
+	}
+	if len(violations) > maxSchemaErrors {
+		violations = violations[:maxSchemaErrors]
+	}
+	return violations
+}
+
+// validateValuesSchema returns how values violate a JSON schema, each as the
+// dotted path of the value, after prefix, and what is wrong with it. It
+// implements the keywords charts use: type, enum, const, properties,
+// patternProperties, additionalProperties, required, items, the bounds of
+// numbers, strings and arrays, pattern, uniqueItems, allOf, anyOf, oneOf, not
+// and local $refs. Other keywords are ignored.
+func validateValuesSchema(schema []byte, values map[string]interface{}, prefix string) []string {
+	var root interface{}
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return []string{"values.schema.json: invalid JSON"}
+	}
+	// Validate the values as JSON, so numbers are float64 like the schema's
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return []string{"values cannot be encoded as JSON"}
+	}
+	var document interface{}
+	json.Unmarshal(encoded, &document)
+
+	v := &schemaValidator{root: root}
+	v.validate(root, document, prefix, 0)
+	return v.violations
+}
+
+type schemaValidator struct {
+	root       interface{}
+	violations []string
+}
+
+func (v *schemaValidator) fail(at, format string, args ...interface{}) {
+	if len(v.violations) >= maxSchemaErrors {
+		return
+	}
+	if at == "" {
+		at = "(root)"
+	}
+	v.violations = append(v.violations, at+": "+fmt.Sprintf(format, args...))
+}
+
+// check reports whether value satisfies schema, without recording violations
+func (v *schemaValidator) check(schema, value interface{}, depth int) bool {
+	trial := &schemaValidator{root: v.root}
+	trial.validate(schema, value, "", depth)
+	return len(trial.violations) == 0
+}
+
+func (v *schemaValidator) validate(schema, value interface{}, at string, depth int) {
+	if depth > maxSchemaDepth {
+		v.fail(at, "schema is nested too deeply")
+		return
+	}
+	if allowed, ok := schema.(bool); ok {
+		if !allowed {
+			v.fail(at, "no value is allowed")
+		}
+		return
+	}
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		if target, found := v.resolve(ref); found {
+			v.validate(target, value, at, depth+1)
+		}
+	}
+
+	if types := schemaTypes(s["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if jsonTypeIs(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(at, "must be %s, not %s", strings.Join(types, " or "), jsonTypeOf(value))
+			return
+		}
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, option := range enum {
+			if reflect.DeepEqual(option, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(at, "must be one of %s", schemaJSON(enum))
+		}
+	}
+	if constant, ok := s["const"]; ok && !reflect.DeepEqual(constant, value) {
+		v.fail(at, "must be %s", schemaJSON(constant))
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(s, value, at, depth)
+	case []interface{}:
+		v.validateArray(s, value, at, depth)
+	case string:
+		length := float64(len([]rune(value)))
+		if min, ok := schemaNumber(s, "minLength"); ok && length < min {
+			v.fail(at, "must be at least %v characters", min)
+		}
+		if max, ok := schemaNumber(s, "maxLength"); ok && length > max {
+			v.fail(at, "must be at most %v characters", max)
+		}
+		if pattern, ok := s["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+				v.fail(at, "must match %s", pattern)
+			}
+		}
+	case float64:
+		if min, ok := schemaNumber(s, "minimum"); ok && value < min {
+			v.fail(at, "must be at least %v", min)
+		}
+		if max, ok := schemaNumber(s, "maximum"); ok && value > max {
+			v.fail(at, "must be at most %v", max)
+		}
+		if min, ok := schemaNumber(s, "exclusiveMinimum"); ok && value <= min {
+			v.fail(at, "must be greater than %v", min)
+		}
+		if max, ok := schemaNumber(s, "exclusiveMaximum"); ok && value >= max {
+			v.fail(at, "must be less than %v", max)
+		}
+		if step, ok := schemaNumber(s, "multipleOf"); ok && step > 0 {
+			if q := value / step; math.Abs(q-math.Round(q)) > 1e-9 {
+				v.fail(at, "must be a multiple of %v", step)
+			}
+		}
+	}
+
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			v.validate(sub, value, at, depth+1)
+		}
+	}
+	if choices, ok := s["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range choices {
+			if v.check(sub, value, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(at, "must match at least one of the allowed schemas")
+		}
+	}
+	if choices, ok := s["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range choices {
+			if v.check(sub, value, depth+1) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			v.fail(at, "must match exactly one of the allowed schemas, matches %d", matches)
+		}
+	}
+	if not, ok := s["not"]; ok && v.check(not, value, depth+1) {
+		v.fail(at, "must not match the disallowed schema")
+	}
+}
+
+func (v *schemaValidator) validateObject(s map[string]interface{}, value map[string]interface{}, at string, depth int) {
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, present := value[key]; !present {
+					v.fail(schemaPath(at, key), "is required")
+				}
+			}
+		}
+	}
+	if min, ok := schemaNumber(s, "minProperties"); ok && float64(len(value)) < min {
+		v.fail(at, "must have at least %v properties", min)
+	}
+	if max, ok := schemaNumber(s, "maxProperties"); ok && float64(len(value)) > max {
+		v.fail(at, "must have at most %v properties", max)
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	patterns, _ := s["patternProperties"].(map[string]interface{})
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		child, matched := value[key], false
+		if sub, ok := properties[key]; ok {
+			v.validate(sub, child, schemaPath(at, key), depth+1)
+			matched = true
+		}
+		for pattern, sub := range patterns {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(key) {
+				v.validate(sub, child, schemaPath(at, key), depth+1)
+				matched = true
+			}
+		}
+		if matched {
+			continue
+		}
+		if additional, ok := s["additionalProperties"]; ok {
+			if allowed, isBool := additional.(bool); isBool && !allowed {
+				v.fail(schemaPath(at, key), "is not allowed")
+				continue
+			}
+			v.validate(additional, child, schemaPath(at, key), depth+1)
+		}
+	}
+}
+
+func (v *schemaValidator) validateArray(s map[string]interface{}, value []interface{}, at string, depth int) {
+	if min, ok := schemaNumber(s, "minItems"); ok && float64(len(value)) < min {
+		v.fail(at, "must have at least %v items", min)
+	}
+	if max, ok := schemaNumber(s, "maxItems"); ok && float64(len(value)) > max {
+		v.fail(at, "must have at most %v items", max)
+	}
+	if unique, _ := s["uniqueItems"].(bool); unique {
+		for i := range value {
+			for j := i + 1; j < len(value); j++ {
+				if reflect.DeepEqual(value[i], value[j]) {
+					v.fail(at, "items must be unique")
+					i = len(value)
+					break
+				}
+			}
+		}
+	}
+	switch items := s["items"].(type) {
+	case []interface{}: // Draft 4-7 tuples
+		for i, item := range value {
+			if i < len(items) {
+				v.validate(items[i], item, fmt.Sprintf("%s[%d]", at, i), depth+1)
+			}
+		}
+	case nil:
+	default:
+		for i, item := range value {
+			v.validate(items, item, fmt.Sprintf("%s[%d]", at, i), depth+1)
+		}
+	}
+}
+
+// resolve follows a $ref within the schema, such as #/definitions/port
+func (v *schemaValidator) resolve(ref string) (interface{}, bool) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, false // Remote schemas are not fetched
+	}
+	current := v.root
+	for _, token := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[token]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func schemaTypes(value interface{}) []string {
+	switch t := value.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func jsonTypeIs(t string, value interface{}) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return jsonTypeOf(value) == t
+}
+
+func jsonTypeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func schemaNumber(s map[string]interface{}, keyword string) (float64, bool) {
+	n, ok := s[keyword].(float64)
+	return n, ok
+}
+
+func schemaPath(at, key string) string {
+	if at == "" {
+		return key
+	}
+	return at + "." + key
+}
+
+func schemaJSON(value interface{}) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
@@ -0,0 +1,1059 @@
+// Package service provides the rendering of Helm chart templates. Charts are
+// Go templates with Helm's objects and functions; the platform implements the
+// functions charts commonly use, and a chart calling another fails to render
+// with the function's name.
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// helmMaxRenderBytes caps the manifests one render writes
+	helmMaxRenderBytes = 16 << 20
+	// helmMaxIncludeDepth caps nested include and tpl calls
+	helmMaxIncludeDepth = 100
+	// helmMaxUntil caps the lists until builds
+	helmMaxUntil = 10000
+	// helmDefaultKubeVersion is what charts see when the cluster's version is unknown
+	helmDefaultKubeVersion = "v1.28.0"
+
+	helmAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	helmDigits   = "0123456789"
+)
+
+// errHelmRenderTooLarge is returned when the manifests exceed helmMaxRenderBytes
+var errHelmRenderTooLarge = fmt.Errorf("rendered manifests are larger than %d MiB", helmMaxRenderBytes>>20)
+
+// helmRenderRelease is the release a chart is rendered for, its .Release
+type helmRenderRelease struct {
+	Name      string
+	Namespace string
+	Revision  int
+	IsInstall bool
+	IsUpgrade bool
+	Service   string
+}
+
+// helmCapabilities is what charts see of the cluster as .Capabilities
+type helmCapabilities struct {
+	KubeVersion helmKubeVersion
+	APIVersions helmAPIVersions
+}
+
+type helmKubeVersion struct {
+	Version    string
+	Major      string
+	Minor      string
+	GitVersion string
+}
+
+// String returns the version, for templates printing .Capabilities.KubeVersion
+func (v helmKubeVersion) String() string {
+	return v.Version
+}
+
+// helmAPIVersions are the API versions the cluster serves. The platform does
+// not discover them; charts see the built-in ones of current Kubernetes.
+type helmAPIVersions []string
+
+// Has reports whether a group/version, or a group/version/kind, is served
+func (a helmAPIVersions) Has(version string) bool {
+	for _, served := range a {
+		if served == version || strings.HasPrefix(version, served+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+var helmBuiltinAPIVersions = helmAPIVersions{
+	"v1", "apps/v1", "batch/v1", "autoscaling/v1", "autoscaling/v2",
+	"networking.k8s.io/v1", "policy/v1", "rbac.authorization.k8s.io/v1",
+	"storage.k8s.io/v1", "scheduling.k8s.io/v1", "coordination.k8s.io/v1",
+	"discovery.k8s.io/v1", "apiextensions.k8s.io/v1", "admissionregistration.k8s.io/v1",
+	"certificates.k8s.io/v1", "node.k8s.io/v1", "events.k8s.io/v1",
+}
+
+// helmFiles are the files of a chart outside its templates, its .Files
+type helmFiles map[string][]byte
+
+// Get returns the contents of a file, empty when there is none
+func (f helmFiles) Get(name string) string {
+	return string(f[name])
+}
+
+// GetBytes returns the contents of a file
+func (f helmFiles) GetBytes(name string) []byte {
+	return f[name]
+}
+
+// Glob returns the files whose paths match a pattern
+func (f helmFiles) Glob(pattern string) helmFiles {
+	matched := helmFiles{}
+	for name, content := range f {
+		if ok, _ := path.Match(pattern, name); ok {
+			matched[name] = content
+		}
+	}
+	return matched
+}
+
+// AsConfig returns the files as the data of a config map, keyed by base name
+func (f helmFiles) AsConfig() string {
+	data := map[string]string{}
+	for name, content := range f {
+		data[path.Base(name)] = string(content)
+	}
+	return helmToYAML(data)
+}
+
+// AsSecrets returns the files as the data of a secret, keyed by base name
+func (f helmFiles) AsSecrets() string {
+	data := map[string]string{}
+	for name, content := range f {
+		data[path.Base(name)] = base64.StdEncoding.EncodeToString(content)
+	}
+	return helmToYAML(data)
+}
+
+// Lines returns the lines of a file
+func (f helmFiles) Lines(name string) []string {
+	if len(f[name]) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(f[name]), "\n"), "\n")
+}
+
+// limitedBuffer is a buffer that refuses writes past a size
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, errHelmRenderTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// renderHelmChart renders the templates of the chart and its enabled subcharts
+// with values merged over the chart's defaults. It returns the manifests by
+// template name, e.g. nginx/templates/service.yaml, leaving out partials and
+// NOTES.txt.
+func renderHelmChart(chart *helmChart, values map[string]interface{}, release helmRenderRelease, kubeVersion string) (map[string]string, error) {
+	if kubeVersion == "" {
+		kubeVersion = helmDefaultKubeVersion
+	}
+	capabilities := helmCapabilities{APIVersions: helmBuiltinAPIVersions}
+	capabilities.KubeVersion.GitVersion = kubeVersion
+	capabilities.KubeVersion.Version = kubeVersion
+	if v, ok := parseSemver(kubeVersion); ok {
+		capabilities.KubeVersion.Version = fmt.Sprintf("v%d.%d.%d", v.major, v.minor, v.patch)
+		capabilities.KubeVersion.Major = strconv.Itoa(v.major)
+		capabilities.KubeVersion.Minor = strconv.Itoa(v.minor)
+	}
+	release.Service = "Helm"
+
+	var root *template.Template
+	depth := 0
+	funcs := helmFuncs()
+	funcs["include"] = func(name string, data interface{}) (string, error) {
+		if depth >= helmMaxIncludeDepth {
+			return "", fmt.Errorf("include %q: nested more than %d deep", name, helmMaxIncludeDepth)
+		}
+		depth++
+		defer func() { depth-- }()
+		var buf limitedBuffer
+		buf.limit = helmMaxRenderBytes
+		if err := root.ExecuteTemplate(&buf, name, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	funcs["tpl"] = func(text string, data interface{}) (string, error) {
+		if depth >= helmMaxIncludeDepth {
+			return "", fmt.Errorf("tpl: nested more than %d deep", helmMaxIncludeDepth)
+		}
+		depth++
+		defer func() { depth-- }()
+		clone, err := root.Clone()
+		if err != nil {
+			return "", err
+		}
+		t, err := clone.New("tpl").Parse(text)
+		if err != nil {
+			return "", err
+		}
+		var buf limitedBuffer
+		buf.limit = helmMaxRenderBytes
+		if err := t.Execute(&buf, data); err != nil {
+			return "", err
+		}
+		return strings.ReplaceAll(buf.String(), "<no value>", ""), nil
+	}
+	root = template.New(chart.Metadata.Name).Funcs(funcs).Option("missingkey=zero")
+
+	// Every template of every chart is parsed into one set, so charts can
+	// include the definitions of their subcharts and library charts
+	type renderTarget struct {
+		name  string
+		chart *helmChart
+		data  map[string]interface{}
+	}
+	var targets []renderTarget
+	var parse func(c *helmChart, prefix string, values map[string]interface{}, enabled bool) error
+	parse = func(c *helmChart, prefix string, values map[string]interface{}, enabled bool) error {
+		for file, text := range c.Templates {
+			name := prefix + "/" + file
+			if _, err := root.New(name).Parse(text); err != nil {
+				return err
+			}
+			base := path.Base(file)
+			if !enabled || c.Metadata.Type == "library" || strings.HasPrefix(base, "_") || base == "NOTES.txt" {
+				continue
+			}
+			targets = append(targets, renderTarget{name: name, chart: c, data: map[string]interface{}{
+				"Values":       values,
+				"Release":      release,
+				"Chart":        helmChartObject(&c.Metadata),
+				"Capabilities": capabilities,
+				"Files":        helmFiles(c.Files),
+				"Template":     map[string]interface{}{"Name": name, "BasePath": prefix + "/templates"},
+			}})
+		}
+		for _, sub := range c.Charts {
+			name, subEnabled := c.dependency(sub, values)
+			if err := parse(sub, prefix+"/charts/"+sub.Metadata.Name, subchartValues(sub, name, values), enabled && subEnabled); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := parse(chart, chart.Metadata.Name, mergeHelmValues(chart.Values, values), true); err != nil {
+		return nil, err
+	}
+
+	manifests := make(map[string]string, len(targets))
+	total := 0
+	for _, target := range targets {
+		buf := limitedBuffer{limit: helmMaxRenderBytes - total}
+		if err := root.ExecuteTemplate(&buf, target.name, target.data); err != nil {
+			return nil, err
+		}
+		total += buf.Len()
+		manifests[target.name] = strings.ReplaceAll(buf.String(), "<no value>", "")
+	}
+	return manifests, nil
+}
+
+// helmChartObject returns a chart's metadata as templates see it, .Chart
+func helmChartObject(metadata *helmChartMetadata) map[string]interface{} {
+	return map[string]interface{}{
+		"Name":        metadata.Name,
+		"Version":     metadata.Version,
+		"AppVersion":  metadata.AppVersion,
+		"Description": metadata.Description,
+		"Type":        metadata.Type,
+		"KubeVersion": metadata.KubeVersion,
+	}
+}
+
+// helmFuncs returns the template functions of Helm and of the Sprig library
+// charts commonly use, less include and tpl, which need the template set
+func helmFuncs() template.FuncMap {
+	return template.FuncMap{
+		// Helm
+		"toYaml":   helmToYAML,
+		"fromYaml": helmFromYAML,
+		"toJson":   helmToJSON,
+		"fromJson": helmFromJSON,
+		"required": helmRequired,
+		"fail":     func(msg string) (string, error) { return "", errors.New(msg) },
+		"lookup":   func(apiVersion, kind, namespace, name string) map[string]interface{} { return map[string]interface{}{} },
+
+		// Defaults and flow
+		"default":  helmDefault,
+		"empty":    helmEmpty,
+		"coalesce": helmCoalesce,
+		"ternary": func(whenTrue, whenFalse interface{}, condition bool) interface{} {
+			if condition {
+				return whenTrue
+			}
+			return whenFalse
+		},
+
+		// Strings
+		"toString":        helmToString,
+		"quote":           func(args ...interface{}) string { return helmQuote(`"`, args) },
+		"squote":          func(args ...interface{}) string { return helmQuote(`'`, args) },
+		"indent":          helmIndent,
+		"nindent":         func(spaces int, s string) string { return "\n" + helmIndent(spaces, s) },
+		"trim":            strings.TrimSpace,
+		"trimAll":         func(cut, s string) string { return strings.Trim(s, cut) },
+		"trimSuffix":      func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"trimPrefix":      func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trunc":           helmTrunc,
+		"upper":           strings.ToUpper,
+		"lower":           strings.ToLower,
+		"title":           helmTitle,
+		"replace":         func(old, replacement, s string) string { return strings.ReplaceAll(s, old, replacement) },
+		"contains":        func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":       func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":       func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"repeat":          func(count int, s string) string { return strings.Repeat(s, count) },
+		"cat":             helmCat,
+		"nospace":         func(s string) string { return strings.Join(strings.Fields(s), "") },
+		"b64enc":          func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec":          helmB64Decode,
+		"sha256sum":       func(s string) string { sum := sha256.Sum256([]byte(s)); return hex.EncodeToString(sum[:]) },
+		"join":            helmJoin,
+		"splitList":       func(sep, s string) []string { return strings.Split(s, sep) },
+		"split":           helmSplit,
+		"regexMatch":      func(pattern, s string) (bool, error) { return regexp.MatchString(pattern, s) },
+		"regexFind":       helmRegexFind,
+		"regexReplaceAll": helmRegexReplaceAll,
+		"randAlphaNum":    func(n int) (string, error) { return helmRandom(n, helmAlphabet+helmDigits) },
+		"randAlpha":       func(n int) (string, error) { return helmRandom(n, helmAlphabet) },
+		"randNumeric":     func(n int) (string, error) { return helmRandom(n, helmDigits) },
+
+		// Dictionaries
+		"dict":   helmDict,
+		"get":    helmGet,
+		"set":    helmSet,
+		"unset":  helmUnset,
+		"hasKey": helmHasKey,
+		"keys":   helmKeys,
+		"values": helmValues,
+		"pick":   helmPick,
+		"omit":   helmOmit,
+		"dig":    helmDig,
+		"merge": func(dst map[string]interface{}, srcs ...map[string]interface{}) map[string]interface{} {
+			return helmMerge(dst, srcs, false)
+		},
+		"mergeOverwrite": func(dst map[string]interface{}, srcs ...map[string]interface{}) map[string]interface{} {
+			return helmMerge(dst, srcs, true)
+		},
+		"deepCopy": helmDeepCopy,
+
+		// Lists
+		"list":    func(items ...interface{}) []interface{} { return items },
+		"first":   helmFirst,
+		"last":    helmLast,
+		"rest":    helmRest,
+		"initial": helmInitial,
+		"append":  func(list interface{}, item interface{}) []interface{} { return append(helmList(list), item) },
+		"prepend": func(list interface{}, item interface{}) []interface{} {
+			return append([]interface{}{item}, helmList(list)...)
+		},
+		"concat":    helmConcat,
+		"uniq":      helmUniq,
+		"has":       func(needle interface{}, list interface{}) bool { return helmIndexOf(helmList(list), needle) >= 0 },
+		"without":   helmWithout,
+		"compact":   helmCompact,
+		"sortAlpha": helmSortAlpha,
+		"toStrings": helmToStrings,
+		"until":     helmUntil,
+
+		// Numbers
+		"int":     func(v interface{}) int { return int(helmToInt64(v)) },
+		"int64":   helmToInt64,
+		"float64": helmToFloat64,
+		"atoi":    func(s string) int { n, _ := strconv.Atoi(strings.TrimSpace(s)); return n },
+		"add":     func(values ...interface{}) int64 { return helmFold(values, func(a, b int64) int64 { return a + b }) },
+		"add1":    func(v interface{}) int64 { return helmToInt64(v) + 1 },
+		"sub":     func(a, b interface{}) int64 { return helmToInt64(a) - helmToInt64(b) },
+		"mul":     func(values ...interface{}) int64 { return helmFold(values, func(a, b int64) int64 { return a * b }) },
+		"div":     helmDiv,
+		"mod":     helmMod,
+		"max": func(values ...interface{}) int64 {
+			return helmFold(values, func(a, b int64) int64 { return max(a, b) })
+		},
+		"min": func(values ...interface{}) int64 {
+			return helmFold(values, func(a, b int64) int64 { return min(a, b) })
+		},
+
+		// Types
+		"kindOf": func(v interface{}) string { return helmKind(v) },
+		"kindIs": func(kind string, v interface{}) bool { return helmKind(v) == kind },
+		"typeOf": func(v interface{}) string { return fmt.Sprintf("%T", v) },
+		"typeIs": func(t string, v interface{}) bool { return fmt.Sprintf("%T", v) == t },
+
+		// Versions and dates
+		"semverCompare": helmSemverCompare,
+		"now":           time.Now,
+		"date":          func(layout string, t time.Time) string { return t.Format(layout) },
+	}
+}
+
+func helmToYAML(v interface{}) string {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func helmFromYAML(s string) map[string]interface{} {
+	values, err := parseHelmValues(s)
+	if err != nil {
+		return map[string]interface{}{"Error": err.Error()}
+	}
+	return values
+}
+
+func helmToJSON(v interface{}) string {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+func helmFromJSON(s string) map[string]interface{} {
+	values := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(s), &values); err != nil {
+		return map[string]interface{}{"Error": err.Error()}
+	}
+	return values
+}
+
+func helmRequired(msg string, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, errors.New(msg)
+	}
+	if s, ok := v.(string); ok && s == "" {
+		return nil, errors.New(msg)
+	}
+	return v, nil
+}
+
+func helmDefault(fallback interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || helmEmpty(given[0]) {
+		return fallback
+	}
+	return given[0]
+}
+
+// helmEmpty reports whether a value is nil or its type's zero value, or an
+// empty string, list or map
+func helmEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return value.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+	case reflect.Pointer, reflect.Interface:
+		return value.IsNil()
+	}
+	return false
+}
+
+func helmCoalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !helmEmpty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+func helmToString(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func helmQuote(mark string, args []interface{}) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == nil {
+			continue
+		}
+		s := helmToString(arg)
+		if mark == `"` {
+			quoted = append(quoted, strconv.Quote(s))
+		} else {
+			quoted = append(quoted, mark+s+mark)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func helmIndent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+func helmTrunc(n int, s string) string {
+	if n < 0 {
+		if -n < len(s) {
+			return s[len(s)+n:]
+		}
+		return s
+	}
+	if n < len(s) {
+		return s[:n]
+	}
+	return s
+}
+
+func helmTitle(s string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+func helmCat(values ...interface{}) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			parts = append(parts, helmToString(v))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func helmB64Decode(s string) string {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return err.Error()
+	}
+	return string(decoded)
+}
+
+func helmJoin(sep string, list interface{}) string {
+	return strings.Join(helmToStrings(list), sep)
+}
+
+func helmSplit(sep, s string) map[string]string {
+	parts := map[string]string{}
+	for i, part := range strings.Split(s, sep) {
+		parts["_"+strconv.Itoa(i)] = part
+	}
+	return parts
+}
+
+func helmRegexFind(pattern, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.FindString(s), nil
+}
+
+func helmRegexReplaceAll(pattern, s, replacement string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, replacement), nil
+}
+
+func helmRandom(n int, alphabet string) (string, error) {
+	if n < 0 || n > 4096 {
+		return "", fmt.Errorf("random strings are at most 4096 characters")
+	}
+	out := make([]byte, n)
+	for i := range out {
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		out[i] = alphabet[index.Int64()]
+	}
+	return string(out), nil
+}
+
+func helmDict(pairs ...interface{}) map[string]interface{} {
+	d := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		d[helmToString(pairs[i])] = pairs[i+1]
+	}
+	if len(pairs)%2 == 1 {
+		d[helmToString(pairs[len(pairs)-1])] = ""
+	}
+	return d
+}
+
+func helmSet(d map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	d[key] = value
+	return d
+}
+
+func helmUnset(d map[string]interface{}, key string) map[string]interface{} {
+	delete(d, key)
+	return d
+}
+
+func helmHasKey(d map[string]interface{}, key string) bool {
+	_, ok := d[key]
+	return ok
+}
+
+func helmGet(d map[string]interface{}, key string) interface{} {
+	if v, ok := d[key]; ok {
+		return v
+	}
+	return ""
+}
+
+func helmKeys(dicts ...map[string]interface{}) []string {
+	var keys []string
+	for _, d := range dicts {
+		for key := range d {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func helmValues(d map[string]interface{}) []interface{} {
+	values := make([]interface{}, 0, len(d))
+	for _, v := range d {
+		values = append(values, v)
+	}
+	return values
+}
+
+func helmPick(d map[string]interface{}, keys ...string) map[string]interface{} {
+	picked := map[string]interface{}{}
+	for _, key := range keys {
+		if v, ok := d[key]; ok {
+			picked[key] = v
+		}
+	}
+	return picked
+}
+
+func helmOmit(d map[string]interface{}, keys ...string) map[string]interface{} {
+	omitted := make(map[string]interface{}, len(d))
+	for key, v := range d {
+		omitted[key] = v
+	}
+	for _, key := range keys {
+		delete(omitted, key)
+	}
+	return omitted
+}
+
+// helmDig follows keys into nested dictionaries: dig "a" "b" default dict
+func helmDig(args ...interface{}) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, fmt.Errorf("dig needs at least one key, a default and a dictionary")
+	}
+	current, ok := args[len(args)-1].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("dig: last argument must be a dictionary")
+	}
+	fallback := args[len(args)-2]
+	keys := args[:len(args)-2]
+	for i, key := range keys {
+		v, found := current[helmToString(key)]
+		if !found {
+			return fallback, nil
+		}
+		if i == len(keys)-1 {
+			return v, nil
+		}
+		if current, ok = v.(map[string]interface{}); !ok {
+			return fallback, nil
+		}
+	}
+	return fallback, nil
+}
+
+// helmMerge merges dictionaries into dst, recursively; keys dst has win
+// unless overwrite is set
+func helmMerge(dst map[string]interface{}, srcs []map[string]interface{}, overwrite bool) map[string]interface{} {
+	for _, src := range srcs {
+		for key, value := range src {
+			existing, present := dst[key]
+			existingMap, existingIsMap := existing.(map[string]interface{})
+			valueMap, valueIsMap := value.(map[string]interface{})
+			switch {
+			case existingIsMap && valueIsMap:
+				dst[key] = helmMerge(existingMap, []map[string]interface{}{valueMap}, overwrite)
+			case !present || overwrite:
+				dst[key] = helmDeepCopy(value)
+			}
+		}
+	}
+	return dst
+}
+
+func helmDeepCopy(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for key, child := range value {
+			copied[key] = helmDeepCopy(child)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, child := range value {
+			copied[i] = helmDeepCopy(child)
+		}
+		return copied
+	}
+	return v
+}
+
+// helmList returns a list of any element type as []interface{}
+func helmList(list interface{}) []interface{} {
+	if items, ok := list.([]interface{}); ok {
+		return items
+	}
+	value := reflect.ValueOf(list)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil
+	}
+	items := make([]interface{}, value.Len())
+	for i := range items {
+		items[i] = value.Index(i).Interface()
+	}
+	return items
+}
+
+func helmFirst(list interface{}) interface{} {
+	if items := helmList(list); len(items) > 0 {
+		return items[0]
+	}
+	return nil
+}
+
+func helmLast(list interface{}) interface{} {
+	if items := helmList(list); len(items) > 0 {
+		return items[len(items)-1]
+	}
+	return nil
+}
+
+func helmRest(list interface{}) []interface{} {
+	if items := helmList(list); len(items) > 0 {
+		return items[1:]
+	}
+	return nil
+}
+
+func helmInitial(list interface{}) []interface{} {
+	if items := helmList(list); len(items) > 0 {
+		return items[:len(items)-1]
+	}
+	return nil
+}
+
+func helmConcat(lists ...interface{}) []interface{} {
+	var out []interface{}
+	for _, list := range lists {
+		out = append(out, helmList(list)...)
+	}
+	return out
+}
+
+func helmIndexOf(items []interface{}, needle interface{}) int {
+	for i, item := range items {
+		if reflect.DeepEqual(item, needle) {
+			return i
+		}
+	}
+	return -1
+}
+
+func helmUniq(list interface{}) []interface{} {
+	var out []interface{}
+	for _, item := range helmList(list) {
+		if helmIndexOf(out, item) < 0 {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func helmWithout(list interface{}, omit ...interface{}) []interface{} {
+	var out []interface{}
+	for _, item := range helmList(list) {
+		if helmIndexOf(omit, item) < 0 {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func helmCompact(list interface{}) []interface{} {
+	var out []interface{}
+	for _, item := range helmList(list) {
+		if !helmEmpty(item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func helmToStrings(list interface{}) []string {
+	items := helmList(list)
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, helmToString(item))
+	}
+	return out
+}
+
+func helmSortAlpha(list interface{}) []string {
+	out := helmToStrings(list)
+	sort.Strings(out)
+	return out
+}
+
+func helmUntil(n int) ([]int, error) {
+	if n > helmMaxUntil {
+		return nil, fmt.Errorf("until: at most %d items", helmMaxUntil)
+	}
+	out := make([]int, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		out = append(out, i)
+	}
+	return out, nil
+}
+
+func helmToInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int64:
+		return n
+	case int32:
+		return int64(n)
+	case float64:
+		return int64(n)
+	case string:
+		parsed, _ := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return int64(parsed)
+	case bool:
+		if n {
+			return 1
+		}
+	}
+	return 0
+}
+
+func helmToFloat64(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case string:
+		parsed, _ := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return parsed
+	}
+	return float64(helmToInt64(v))
+}
+
+func helmFold(values []interface{}, op func(a, b int64) int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	result := helmToInt64(values[0])
+	for _, v := range values[1:] {
+		result = op(result, helmToInt64(v))
+	}
+	return result
+}
+
+func helmDiv(a, b interface{}) (int64, error) {
+	if helmToInt64(b) == 0 {
+		return 0, fmt.Errorf("div: division by zero")
+	}
+	return helmToInt64(a) / helmToInt64(b), nil
+}
+
+func helmMod(a, b interface{}) (int64, error) {
+	if helmToInt64(b) == 0 {
+		return 0, fmt.Errorf("mod: division by zero")
+	}
+	return helmToInt64(a) % helmToInt64(b), nil
+}
+
+// helmKind returns the kind of a value as Sprig names it, e.g. map or slice
+func helmKind(v interface{}) string {
+	if v == nil {
+		return "invalid"
+	}
+	return reflect.ValueOf(v).Kind().String()
+}
+
+// semver is a parsed semantic version; build metadata is dropped
+type semver struct {
+	major, minor, patch int
+	pre                 string
+}
+
+var semverPattern = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// parseSemver parses a version such as v1.28.3-gke.100; minor and patch
+// default to 0
+func parseSemver(version string) (semver, bool) {
+	match := semverPattern.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return semver{}, false
+	}
+	v := semver{pre: match[4]}
+	v.major, _ = strconv.Atoi(match[1])
+	v.minor, _ = strconv.Atoi(match[2])
+	v.patch, _ = strconv.Atoi(match[3])
+	return v, true
+}
+
+// compareSemver orders versions; a prerelease comes before its release
+func compareSemver(a, b semver) int {
+	for _, d := range []int{a.major - b.major, a.minor - b.minor, a.patch - b.patch} {
+		if d != 0 {
+			return d
+		}
+	}
+	switch {
+	case a.pre == b.pre:
+		return 0
+	case a.pre == "":
+		return 1
+	case b.pre == "":
+		return -1
+	}
+	return strings.Compare(a.pre, b.pre)
+}
+
+// helmSemverCompare reports whether a version satisfies a constraint such as
+// ">=1.19-0", "~1.2", "^2" or ">= 1.20, < 1.30 || 2.x". Prereleases are
+// compared as their release, as charts write "-0" to admit them.
+func helmSemverCompare(constraint, version string) (bool, error) {
+	v, ok := parseSemver(version)
+	if !ok {
+		return false, fmt.Errorf("invalid semantic version %q", version)
+	}
+	v.pre = ""
+	for _, alternative := range strings.Split(constraint, "||") {
+		satisfied := true
+		fields := strings.FieldsFunc(strings.ReplaceAll(alternative, ",", " "), func(r rune) bool { return r == ' ' })
+		// Join operators written apart from their version, as in ">= 1.20"
+		var terms []string
+		for _, field := range fields {
+			if len(terms) > 0 && strings.Trim(terms[len(terms)-1], "<>=!~^") == "" {
+				terms[len(terms)-1] += field
+				continue
+			}
+			terms = append(terms, field)
+		}
+		for _, term := range terms {
+			ok, err := semverSatisfies(term, v)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied && len(terms) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func semverSatisfies(term string, v semver) (bool, error) {
+	op := strings.TrimRight(term, "0123456789.xX*-+abcdefghijklmnopqrstuvwyzABCDEFGHIJKLMNOPQRSTUVWYZ")
+	bound := strings.TrimPrefix(term, op)
+	if bound == "" || bound == "*" || strings.EqualFold(bound, "x") {
+		return true, nil
+	}
+	// Wildcards: 1.x matches every 1.*
+	parts := strings.Split(strings.SplitN(bound, "-", 2)[0], ".")
+	wildcard := -1
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			wildcard = i
+			break
+		}
+	}
+	if wildcard >= 0 {
+		bound = strings.Join(parts[:wildcard], ".")
+		if op == "" || op == "=" {
+			op = "~"
+			if wildcard == 1 {
+				op = "^"
+			}
+		}
+	}
+	b, ok := parseSemver(bound)
+	if !ok {
+		return false, fmt.Errorf("invalid semantic version constraint %q", term)
+	}
+	b.pre = ""
+	c := compareSemver(v, b)
+	switch op {
+	case "", "=", "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=", "=>":
+		return c >= 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=", "=<":
+		return c <= 0, nil
+	case "~", "~>": // Patch releases, or minor ones when only the major is given
+		if c < 0 || v.major != b.major {
+			return false, nil
+		}
+		return strings.Count(bound, ".") == 0 || v.minor == b.minor, nil
+	case "^": // Releases up to the next major, or minor when the major is 0
+		if c < 0 || v.major != b.major {
+			return false, nil
+		}
+		return b.major != 0 || v.minor == b.minor, nil
+	}
+	return false, fmt.Errorf("invalid semantic version constraint %q", term)
+}
@@ -0,0 +1,360 @@
+// Package service provides anomaly detection on the metrics host agents report
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// hostAnomalyInterval is how often host rules are checked for a due evaluation
+	hostAnomalyInterval = time.Minute
+	// hostMetricsPruneInterval is how often samples past the retention are deleted
+	hostMetricsPruneInterval = time.Hour
+	// maxHostAnomalyWindow caps the history a rule judges each sample against
+	maxHostAnomalyWindow = 10000
+	// criticalAnomalyDeviation is the deviation from which anomalies are critical
+	criticalAnomalyDeviation = 5
+)
+
+// ErrInvalidAnomalyRule is returned when an anomaly rule's source is misconfigured
+var ErrInvalidAnomalyRule = errors.New("invalid anomaly detection rule")
+
+// HostAnomalyService keeps the history of the metrics agents report and runs the
+// anomaly detection rules that target them. Anomalies are recorded per host and
+// resolved once the host's metric is back to normal.
+type HostAnomalyService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	events   *EventBus
+	flags    *FeatureFlagService
+	settings *SettingsService
+}
+
+// NewHostAnomalyService creates a new host anomaly service
+func NewHostAnomalyService(db *gorm.DB, logger *zap.Logger) *HostAnomalyService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &HostAnomalyService{db: db, logger: logger}
+}
+
+// SetEventBus sets the bus detected anomalies are published on
+func (s *HostAnomalyService) SetEventBus(events *EventBus) {
+	s.events = events
+}
+
+// SetFeatureFlags sets the flags that gate scheduled anomaly detection
+func (s *HostAnomalyService) SetFeatureFlags(flags *FeatureFlagService) {
+	s.flags = flags
+}
+
+// SetSettings sets the runtime settings the sample retention is read from
+func (s *HostAnomalyService) SetSettings(settings *SettingsService) {
+	s.settings = settings
+}
+
+// Record stores the utilization a host reported at the given time
+func (s *HostAnomalyService) Record(hostID uuid.UUID, metrics *model.HostMetricsReport, disks []model.HostDiskUsage, at time.Time) error {
+	if metrics == nil {
+		return nil
+	}
+	sample := &model.HostMetric{
+		HostID:               hostID,
+		Timestamp:            at.Unix(),
+		CPUUsagePercent:      metrics.CPUUsagePercent,
+		Load1:                metrics.Load1,
+		Load5:                metrics.Load5,
+		Load15:               metrics.Load15,
+		MemoryUsedBytes:      int64(metrics.MemoryUsed),
+		MemoryAvailableBytes: int64(metrics.MemoryAvailable),
+		SwapUsedBytes:        int64(metrics.SwapUsed),
+	}
+	for _, d := range disks {
+		if d.Total == 0 {
+			continue
+		}
+		if used := float64(d.Used) / float64(d.Total) * 100; used > sample.DiskUsagePercent {
+			sample.DiskUsagePercent = used
+		}
+	}
+	return s.db.Create(sample).Error
+}
+
+// ValidateHostRule checks the host source of a rule
+func ValidateHostRule(rule *model.AnomalyDetectionRule) error {
+	if !model.IsHostMetric(rule.HostMetric) {
+		return fmt.Errorf("%w: unknown host metric %q", ErrInvalidAnomalyRule, rule.HostMetric)
+	}
+	if !supportsAlgorithm(rule.Algorithm) {
+		return fmt.Errorf("%w: host rules support the baseline, stl and isolation_forest algorithms", ErrInvalidAnomalyRule)
+	}
+	if rule.WindowSize < minAnomalySamples || rule.WindowSize > maxHostAnomalyWindow {
+		return fmt.Errorf("%w: windowSize must be between %d and %d", ErrInvalidAnomalyRule, minAnomalySamples, maxHostAnomalyWindow)
+	}
+	return nil
+}
+
+// Evaluate judges the latest sample of every host the rule targets against the
+// samples before it and returns the anomalies found, new and ongoing. Hosts
+// without recent samples or enough history are skipped.
+func (s *HostAnomalyService) Evaluate(ctx context.Context, rule *model.AnomalyDetectionRule) ([]model.AnomalyEvent, error) {
+	if err := ValidateHostRule(rule); err != nil {
+		return nil, err
+	}
+
+	query := s.db.Select("id, hostname, tags").
+		Where("status IN ?", []model.HostStatus{model.HostStatusApproved, model.HostStatusOnline, model.HostStatusDegraded})
+	if len(rule.HostTags) > 0 {
+		query = query.Where("tags && ?", pq.Array([]string(rule.HostTags)))
+	}
+	var hosts []model.Host
+	if err := query.Find(&hosts).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	// Samples older than two evaluations belong to hosts that stopped reporting
+	staleAfter := 2 * time.Duration(rule.EvalInterval) * time.Second
+	if staleAfter < 2*hostAnomalyInterval {
+		staleAfter = 2 * hostAnomalyInterval
+	}
+
+	var found []model.AnomalyEvent
+	detected := 0
+	for i := range hosts {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		event, created, err := s.evaluateHost(rule, &hosts[i], now.Add(-staleAfter))
+		if err != nil {
+			return nil, err
+		}
+		if event != nil {
+			found = append(found, *event)
+			if created {
+				detected++
+			}
+		}
+	}
+
+	updates := map[string]interface{}{
+		"last_eval_at":      now,
+		"total_evaluations": gorm.Expr("total_evaluations + 1"),
+	}
+	if detected > 0 {
+		updates["anomalies_detected"] = gorm.Expr("anomalies_detected + ?", detected)
+		updates["last_anomaly_at"] = now
+	}
+	if err := s.db.Model(&model.AnomalyDetectionRule{}).Where("id = ?", rule.ID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// evaluateHost judges one host's latest sample. It returns the host's open
+// anomaly while the sample is anomalous, and whether it was just created; a
+// normal sample resolves the open anomaly.
+func (s *HostAnomalyService) evaluateHost(rule *model.AnomalyDetectionRule, host *model.Host, staleBefore time.Time) (*model.AnomalyEvent, bool, error) {
+	var samples []model.HostMetric
+	if err := s.db.Where("host_id = ?", host.ID).Order("timestamp DESC").Limit(rule.WindowSize + 1).Find(&samples).Error; err != nil {
+		return nil, false, err
+	}
+	if len(samples) == 0 || samples[0].Timestamp < staleBefore.Unix() {
+		return nil, false, nil
+	}
+
+	value, ok := samples[0].Value(rule.HostMetric)
+	if !ok {
+		return nil, false, nil
+	}
+	history := make([]float64, 0, len(samples)-1)
+	for i := len(samples) - 1; i > 0; i-- {
+		if v, ok := samples[i].Value(rule.HostMetric); ok {
+			history = append(history, v)
+		}
+	}
+	if len(history) < minAnomalySamples {
+		return nil, false, nil
+	}
+
+	score, err := detectAnomaly(rule.Algorithm, history, value, rule.Sensitivity)
+	if err != nil {
+		return nil, false, err
+	}
+	// Static bounds, when set, flag values outside them whatever the history
+	outOfBounds := rule.MaxValue > rule.MinValue && (value < rule.MinValue || value > rule.MaxValue)
+	if outOfBounds {
+		score.Anomalous, score.Confidence = true, 1
+	}
+
+	var open model.AnomalyEvent
+	err = s.db.Where("rule_id = ? AND host_id = ? AND status IN ?", rule.ID, host.ID,
+		[]string{model.AnomalyStatusActive, model.AnomalyStatusAcknowledged}).
+		Order("created_at DESC").First(&open).Error
+	hasOpen := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	if !score.Anomalous || score.Confidence < rule.AlertThreshold {
+		if hasOpen {
+			now := time.Now()
+			err := s.db.Model(&open).Updates(map[string]interface{}{
+				"status":        model.AnomalyStatusResolved,
+				"resolved_at":   now,
+				"current_value": value,
+			}).Error
+			return nil, false, err
+		}
+		return nil, false, nil
+	}
+
+	severity := "warning"
+	if outOfBounds || score.Deviation >= criticalAnomalyDeviation {
+		severity = "critical"
+	}
+	from := time.Unix(samples[len(samples)-1].Timestamp, 0).UTC()
+	to := time.Unix(samples[0].Timestamp, 0).UTC()
+
+	event := &open
+	if !hasOpen {
+		hostID := host.ID
+		labels, _ := json.Marshal(map[string]string{"host": host.Hostname, "hostId": host.ID.String()})
+		event = &model.AnomalyEvent{
+			RuleID:     rule.ID,
+			UserID:     rule.UserID,
+			HostID:     &hostID,
+			MetricName: rule.HostMetric,
+			Labels:     string(labels),
+			Status:     model.AnomalyStatusActive,
+		}
+	}
+	event.Severity = severity
+	event.CurrentValue = value
+	event.ExpectedValue = score.Expected
+	event.Deviation = score.Deviation
+	event.Confidence = score.Confidence
+	event.TimeRange = from.Format(time.RFC3339) + "/" + to.Format(time.RFC3339)
+	event.Description = fmt.Sprintf("%s on %s is %.2f, expected about %.2f",
+		rule.HostMetric, host.Hostname, value, score.Expected)
+
+	if hasOpen {
+		err := s.db.Model(event).
+			Select("severity", "current_value", "expected_value", "deviation", "confidence", "time_range", "description").
+			Updates(event).Error
+		return event, false, err
+	}
+	if err := s.db.Create(event).Error; err != nil {
+		return nil, false, err
+	}
+
+	s.events.Publish(rule.UserID, model.EventAnomalyDetected, map[string]string{
+		"anomalyId": event.ID.String(),
+		"ruleId":    rule.ID.String(),
+		"severity":  severity,
+		"hostId":    host.ID.String(),
+	}, event)
+	return event, true, nil
+}
+
+// HostEvents returns a host's anomalies, newest first, optionally only those
+// with status
+func (s *HostAnomalyService) HostEvents(hostID uuid.UUID, status string, limit int) ([]model.AnomalyEvent, error) {
+	query := s.db.Preload("Rule").Where("host_id = ?", hostID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var events []model.AnomalyEvent
+	if err := query.Order("created_at DESC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ============== Scheduled Evaluation ==============
+
+// Run evaluates the host rules that are due every minute and prunes samples
+// past the metrics retention every hour until ctx is done
+func (s *HostAnomalyService) Run(ctx context.Context) {
+	ticker := time.NewTicker(hostAnomalyInterval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		s.runDue(ctx)
+		if time.Since(lastPrune) >= hostMetricsPruneInterval {
+			lastPrune = time.Now()
+			if deleted, err := s.Prune(); err != nil {
+				s.logger.Error("failed to prune host metrics", zap.Error(err))
+			} else if deleted > 0 {
+				s.logger.Info("pruned host metrics", zap.Int64("deleted", deleted))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDue evaluates every enabled host rule whose interval has passed. A rule is
+// claimed by moving its last evaluation, so each evaluation happens once even
+// with several gateway replicas.
+func (s *HostAnomalyService) runDue(ctx context.Context) {
+	var rules []model.AnomalyDetectionRule
+	if err := s.db.Where("enabled = ? AND source_type = ?", true, model.AnomalySourceHost).Find(&rules).Error; err != nil {
+		s.logger.Error("failed to load host anomaly rules", zap.Error(err))
+		return
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		now := time.Now()
+		if rule.LastEvalAt != nil && now.Before(rule.LastEvalAt.Add(time.Duration(rule.EvalInterval)*time.Second)) {
+			continue
+		}
+		if !s.flags.IsEnabled(rule.UserID, model.FeatureAnomalyDetection) {
+			continue
+		}
+
+		claim := s.db.Model(&model.AnomalyDetectionRule{}).Where("id = ?", rule.ID)
+		if rule.LastEvalAt == nil {
+			claim = claim.Where("last_eval_at IS NULL")
+		} else {
+			claim = claim.Where("last_eval_at = ?", *rule.LastEvalAt)
+		}
+		claim = claim.Update("last_eval_at", now)
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+
+		if _, err := s.Evaluate(ctx, rule); err != nil {
+			s.logger.Error("failed to evaluate host anomaly rule", zap.String("rule", rule.Name), zap.Error(err))
+		}
+	}
+}
+
+// Prune deletes samples older than the metrics retention setting and returns the
+// number deleted
+func (s *HostAnomalyService) Prune() (int64, error) {
+	if s.settings == nil {
+		return 0, nil
+	}
+	retention := s.settings.Duration(model.SettingMetricsRetention)
+	if retention <= 0 {
+		return 0, nil
+	}
+	result := s.db.Where("timestamp < ?", time.Now().Add(-retention).Unix()).Delete(&model.HostMetric{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,427 @@
+// Package service provides actions on many hosts at once, and the approval of
+// the destructive ones
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxBulkHosts bounds the hosts one bulk action can change
+	maxBulkHosts = 500
+	// hostBulkApprovalTTL is how long a destructive bulk action waits for approval
+	hostBulkApprovalTTL = 24 * time.Hour
+	// agentConfigUpdateTimeout is how long an agent has to apply new settings once
+	// it picked them up
+	agentConfigUpdateTimeout = 30 * time.Second
+	// maxHostTagLength and maxHostGroupLength bound tags and group names
+	maxHostTagLength   = 63
+	maxHostGroupLength = 63
+	// Bounds of the intervals agents can be set to, in seconds
+	minAgentInterval = 5
+	maxAgentInterval = 3600
+)
+
+var (
+	// ErrInvalidHostBulk is returned for bulk actions that cannot be applied as requested
+	ErrInvalidHostBulk = errors.New("invalid bulk host action")
+	// ErrHostBulkApprovalNotFound is returned when an approval does not exist
+	ErrHostBulkApprovalNotFound = errors.New("bulk host approval not found")
+	// ErrHostBulkApprovalClosed is returned when an approval was already
+	// reviewed or has expired
+	ErrHostBulkApprovalClosed = errors.New("bulk host approval is no longer pending")
+	// ErrHostBulkSelfApproval is returned when a user approves their own bulk action
+	ErrHostBulkSelfApproval = errors.New("a bulk host action must be approved by another user")
+)
+
+// hostBulkPermissions is the host permission a bulk action needs on each host it changes
+var hostBulkPermissions = map[model.HostBulkAction]string{
+	model.HostBulkDelete:      "delete",
+	model.HostBulkRetire:      "delete",
+	model.HostBulkTags:        "update",
+	model.HostBulkLabels:      "update",
+	model.HostBulkAgentConfig: "update",
+	model.HostBulkMove:        "update",
+}
+
+// HostBulkService applies actions to many hosts at once, host by host, so one
+// host failing does not stop the others. Deleting and retiring hosts only
+// happens once another user approved it; holders of hosts.bulk_approve review
+// these requests.
+type HostBulkService struct {
+	db        *gorm.DB
+	logger    *zap.Logger
+	commands  *AgentCommandService
+	lifecycle *HostLifecycleService
+}
+
+// NewHostBulkService creates a new bulk host action service
+func NewHostBulkService(db *gorm.DB, logger *zap.Logger, commands *AgentCommandService, lifecycle *HostLifecycleService) *HostBulkService {
+	return &HostBulkService{db: db, logger: logger, commands: commands, lifecycle: lifecycle}
+}
+
+// Apply applies a bulk action that needs no approval, as userID
+func (s *HostBulkService) Apply(ctx context.Context, userID uuid.UUID, action model.HostBulkAction, req *model.HostBulkRequest) (*model.HostBulkResult, error) {
+	if err := validateHostBulk(action, req); err != nil {
+		return nil, err
+	}
+	if action.Destructive() {
+		return nil, fmt.Errorf("%w: %s needs approval", ErrInvalidHostBulk, action)
+	}
+	result := s.apply(ctx, userID, action, req)
+	s.logger.Info("bulk host action applied",
+		zap.String("action", string(action)),
+		zap.String("user_id", userID.String()),
+		zap.Int("succeeded", result.Succeeded),
+		zap.Int("failed", result.Failed))
+	return result, nil
+}
+
+// RequestApproval records a destructive bulk action requested by userID, to be
+// applied once another user approves it
+func (s *HostBulkService) RequestApproval(ctx context.Context, userID uuid.UUID, action model.HostBulkAction, req *model.HostBulkRequest) (*model.HostBulkApproval, error) {
+	if err := validateHostBulk(action, req); err != nil {
+		return nil, err
+	}
+	if !action.Destructive() {
+		return nil, fmt.Errorf("%w: %s needs no approval", ErrInvalidHostBulk, action)
+	}
+
+	req.HostIDs = uniqueHostIDs(req.HostIDs)
+	approval := &model.HostBulkApproval{
+		ID:          uuid.New(),
+		Action:      action,
+		Request:     *req,
+		Status:      model.HostBulkApprovalPending,
+		RequestedBy: userID,
+		ExpiresAt:   time.Now().Add(hostBulkApprovalTTL),
+	}
+	if err := s.db.WithContext(ctx).Create(approval).Error; err != nil {
+		return nil, fmt.Errorf("failed to record bulk host approval: %w", err)
+	}
+	s.logger.Info("bulk host action awaiting approval",
+		zap.String("approval_id", approval.ID.String()),
+		zap.String("action", string(action)),
+		zap.String("user_id", userID.String()),
+		zap.Int("hosts", len(req.HostIDs)))
+	return approval, nil
+}
+
+// ListApprovals returns a page of approvals, newest first, optionally of one status only
+func (s *HostBulkService) ListApprovals(ctx context.Context, status model.HostBulkApprovalStatus, page, pageSize int) ([]model.HostBulkApproval, int64, error) {
+	if err := s.expire(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	query := s.db.WithContext(ctx).Model(&model.HostBulkApproval{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var approvals []model.HostBulkApproval
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&approvals).Error; err != nil {
+		return nil, 0, err
+	}
+	return approvals, total, nil
+}
+
+// GetApproval returns an approval
+func (s *HostBulkService) GetApproval(ctx context.Context, id uuid.UUID) (*model.HostBulkApproval, error) {
+	if err := s.expire(ctx); err != nil {
+		return nil, err
+	}
+	var approval model.HostBulkApproval
+	if err := s.db.WithContext(ctx).First(&approval, "id = ?", id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrHostBulkApprovalNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
+
+// Approve approves a pending bulk action and applies it. The hosts are changed
+// with the permissions of the user who requested the action, as they are when
+// it is applied.
+func (s *HostBulkService) Approve(ctx context.Context, id, reviewerID uuid.UUID, comment string) (*model.HostBulkApproval, error) {
+	approval, err := s.review(ctx, id, reviewerID, model.HostBulkApprovalApproved, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.apply(ctx, approval.RequestedBy, approval.Action, &approval.Request)
+	approval.Result = result
+	if err := s.db.WithContext(ctx).Model(approval).Select("result").Updates(approval).Error; err != nil {
+		s.logger.Error("failed to record bulk host action result",
+			zap.String("approval_id", approval.ID.String()), zap.Error(err))
+	}
+	s.logger.Info("bulk host action approved and applied",
+		zap.String("approval_id", approval.ID.String()),
+		zap.String("action", string(approval.Action)),
+		zap.String("requested_by", approval.RequestedBy.String()),
+		zap.String("reviewed_by", reviewerID.String()),
+		zap.Int("succeeded", result.Succeeded),
+		zap.Int("failed", result.Failed))
+	return approval, nil
+}
+
+// Reject rejects a pending bulk action. Requesters may reject, and so withdraw,
+// their own.
+func (s *HostBulkService) Reject(ctx context.Context, id, reviewerID uuid.UUID, comment string) (*model.HostBulkApproval, error) {
+	approval, err := s.review(ctx, id, reviewerID, model.HostBulkApprovalRejected, comment)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("bulk host action rejected",
+		zap.String("approval_id", approval.ID.String()),
+		zap.String("action", string(approval.Action)),
+		zap.String("reviewed_by", reviewerID.String()))
+	return approval, nil
+}
+
+// review moves a pending approval to status. The update only matches a pending
+// approval, so concurrent reviews cannot both apply.
+func (s *HostBulkService) review(ctx context.Context, id, reviewerID uuid.UUID, status model.HostBulkApprovalStatus, comment string) (*model.HostBulkApproval, error) {
+	approval, err := s.GetApproval(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if approval.Status != model.HostBulkApprovalPending {
+		return nil, ErrHostBulkApprovalClosed
+	}
+	if status == model.HostBulkApprovalApproved && approval.RequestedBy == reviewerID {
+		return nil, ErrHostBulkSelfApproval
+	}
+
+	now := time.Now()
+	updated := s.db.WithContext(ctx).Model(&model.HostBulkApproval{}).
+		Where("id = ? AND status = ? AND expires_at > ?", id, model.HostBulkApprovalPending, now).
+		Updates(map[string]interface{}{
+			"status":         status,
+			"reviewed_by":    reviewerID,
+			"review_comment": comment,
+			"reviewed_at":    now,
+		})
+	if updated.Error != nil {
+		return nil, updated.Error
+	}
+	if updated.RowsAffected == 0 {
+		return nil, ErrHostBulkApprovalClosed
+	}
+	approval.Status, approval.ReviewedBy, approval.ReviewComment, approval.ReviewedAt = status, &reviewerID, comment, &now
+	return approval, nil
+}
+
+// expire marks the pending approvals past their deadline as expired
+func (s *HostBulkService) expire(ctx context.Context) error {
+	return s.db.WithContext(ctx).Model(&model.HostBulkApproval{}).
+		Where("status = ? AND expires_at <= ?", model.HostBulkApprovalPending, time.Now()).
+		Update("status", model.HostBulkApprovalExpired).Error
+}
+
+// apply applies an action to each host in turn, as userID
+func (s *HostBulkService) apply(ctx context.Context, userID uuid.UUID, action model.HostBulkAction, req *model.HostBulkRequest) *model.HostBulkResult {
+	ids := uniqueHostIDs(req.HostIDs)
+	result := &model.HostBulkResult{Action: action, Items: make([]model.HostBulkItemResult, 0, len(ids))}
+
+	var hosts []model.Host
+	loadErr := s.db.WithContext(ctx).Where("id IN ?", ids).Find(&hosts).Error
+	byID := make(map[uuid.UUID]*model.Host, len(hosts))
+	for i := range hosts {
+		byID[hosts[i].ID] = &hosts[i]
+	}
+
+	permission := hostBulkPermissions[action]
+	for _, id := range ids {
+		item := model.HostBulkItemResult{HostID: id}
+		host, found := byID[id]
+		switch {
+		case loadErr != nil:
+			item.Error = "failed to load host"
+		case !found:
+			item.Error = "host not found"
+		case !model.UserHasPermission(s.db, userID, "hosts", permission, &id, "host").Allowed:
+			item.Error = fmt.Sprintf("permission hosts.%s required", permission)
+		default:
+			commandID, err := s.applyOne(ctx, userID, action, req, host)
+			if err != nil {
+				item.Error = err.Error()
+			}
+			item.CommandID = commandID
+		}
+
+		if item.Error == "" {
+			item.Status = model.HostBulkItemSucceeded
+			result.Succeeded++
+		} else {
+			item.Status = model.HostBulkItemFailed
+			result.Failed++
+		}
+		result.Items = append(result.Items, item)
+	}
+	return result
+}
+
+// applyOne applies an action to one host, returning the command queued for its
+// agent if any
+func (s *HostBulkService) applyOne(ctx context.Context, userID uuid.UUID, action model.HostBulkAction, req *model.HostBulkRequest, host *model.Host) (*uuid.UUID, error) {
+	db := s.db.WithContext(ctx)
+	var err error
+	switch action {
+	case model.HostBulkDelete:
+		err = db.Delete(&model.Host{}, "id = ?", host.ID).Error
+	case model.HostBulkRetire:
+		if host.Lifecycle == model.HostLifecycleRetired {
+			return nil, nil
+		}
+		_, err = s.lifecycle.Decommission(ctx, &userID, host, req.Reason)
+		if errors.Is(err, ErrInvalidHostLifecycle) || errors.Is(err, ErrHostLifecycleConflict) {
+			return nil, err
+		}
+	case model.HostBulkTags:
+		err = db.Model(host).Update("tags", changeHostTags(host.Tags, req.AddTags, req.RemoveTags)).Error
+	case model.HostBulkLabels:
+		labels := make(model.LabelMap, len(host.Labels)+len(req.SetLabels))
+		for k, v := range host.Labels {
+			labels[k] = v
+		}
+		for _, k := range req.RemoveLabels {
+			delete(labels, k)
+		}
+		for k, v := range req.SetLabels {
+			labels[k] = v
+		}
+		err = db.Model(host).Update("labels", labels).Error
+	case model.HostBulkAgentConfig:
+		if host.Status == model.HostStatusPending || agentRefused(host) {
+			return nil, errors.New("agents of pending, rejected or decommissioned hosts take no commands")
+		}
+		cmd, err := s.commands.Queue(ctx, host.ID, &userID, model.AgentCommandConfigUpdate, req.AgentConfig, agentConfigUpdateTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return &cmd.ID, nil
+	case model.HostBulkMove:
+		err = db.Model(host).Update("host_group", req.Group).Error
+	}
+	if err != nil {
+		s.logger.Error("bulk host action failed on host",
+			zap.String("action", string(action)), zap.String("host_id", host.ID.String()), zap.Error(err))
+		return nil, errors.New("failed to update host")
+	}
+	return nil, nil
+}
+
+// validateHostBulk checks that a bulk action can be applied as requested
+func validateHostBulk(action model.HostBulkAction, req *model.HostBulkRequest) error {
+	if !action.Valid() {
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidHostBulk, action)
+	}
+	if len(req.HostIDs) == 0 {
+		return fmt.Errorf("%w: no hosts", ErrInvalidHostBulk)
+	}
+	if len(req.HostIDs) > maxBulkHosts {
+		return fmt.Errorf("%w: at most %d hosts can be changed at once", ErrInvalidHostBulk, maxBulkHosts)
+	}
+
+	switch action {
+	case model.HostBulkTags:
+		if len(req.AddTags) == 0 && len(req.RemoveTags) == 0 {
+			return fmt.Errorf("%w: no tags to add or remove", ErrInvalidHostBulk)
+		}
+		for _, tag := range append(append([]string(nil), req.AddTags...), req.RemoveTags...) {
+			if tag == "" || strings.TrimSpace(tag) != tag || len(tag) > maxHostTagLength {
+				return fmt.Errorf("%w: tag %q must be 1 to %d characters without surrounding spaces", ErrInvalidHostBulk, tag, maxHostTagLength)
+			}
+		}
+	case model.HostBulkLabels:
+		if len(req.SetLabels) == 0 && len(req.RemoveLabels) == 0 {
+			return fmt.Errorf("%w: no labels to set or remove", ErrInvalidHostBulk)
+		}
+		if err := sanitize.Labels(req.SetLabels); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidHostBulk, err)
+		}
+		for _, key := range req.RemoveLabels {
+			if err := sanitize.Labels(map[string]string{key: ""}); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidHostBulk, err)
+			}
+		}
+	case model.HostBulkAgentConfig:
+		return validateAgentConfigUpdate(req.AgentConfig)
+	case model.HostBulkMove:
+		return ValidateHostGroup(req.Group)
+	}
+	return nil
+}
+
+// validateAgentConfigUpdate checks that agent settings are within bounds
+func validateAgentConfigUpdate(update *model.AgentConfigUpdate) error {
+	if update == nil || *update == (model.AgentConfigUpdate{}) {
+		return fmt.Errorf("%w: no agent settings to change", ErrInvalidHostBulk)
+	}
+	for name, interval := range map[string]*int{
+		"reportInterval":      update.ReportInterval,
+		"heartbeatInterval":   update.HeartbeatInterval,
+		"commandPollInterval": update.CommandPollInterval,
+	} {
+		if interval != nil && (*interval < minAgentInterval || *interval > maxAgentInterval) {
+			return fmt.Errorf("%w: %s must be between %d and %d seconds", ErrInvalidHostBulk, name, minAgentInterval, maxAgentInterval)
+		}
+	}
+	return nil
+}
+
+// ValidateHostGroup checks a host group name: empty, for no group, or a label value
+func ValidateHostGroup(group string) error {
+	if len(group) > maxHostGroupLength {
+		return fmt.Errorf("%w: group names are at most %d characters", ErrInvalidHostBulk, maxHostGroupLength)
+	}
+	if err := sanitize.Labels(map[string]string{"group": group}); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidHostBulk, err)
+	}
+	return nil
+}
+
+// changeHostTags returns tags without remove and with add, keeping their order
+func changeHostTags(tags pq.StringArray, add, remove []string) pq.StringArray {
+	removed := make(map[string]bool, len(remove))
+	for _, tag := range remove {
+		removed[tag] = true
+	}
+	seen := make(map[string]bool, len(tags)+len(add))
+	changed := make(pq.StringArray, 0, len(tags)+len(add))
+	for _, tag := range append(append([]string(nil), tags...), add...) {
+		if !seen[tag] && !removed[tag] {
+			seen[tag] = true
+			changed = append(changed, tag)
+		}
+	}
+	return changed
+}
+
+// uniqueHostIDs drops repeated IDs, keeping the first of each
+func uniqueHostIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,200 @@
+// Package service provides agent heartbeat tracking for hosts
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// HostHeartbeatService moves hosts between online, degraded and offline as their
+// agents stop and resume reporting, and announces every transition
+type HostHeartbeatService struct {
+	db            *gorm.DB
+	logger        *zap.Logger
+	events        *EventBus
+	notifications *NotificationService
+	degradedAfter time.Duration
+	offlineAfter  time.Duration
+}
+
+// NewHostHeartbeatService creates a new heartbeat service
+func NewHostHeartbeatService(db *gorm.DB, logger *zap.Logger, degradedAfter, offlineAfter time.Duration) *HostHeartbeatService {
+	return &HostHeartbeatService{
+		db:            db,
+		logger:        logger,
+		notifications: NewNotificationService(db, logger),
+		degradedAfter: degradedAfter,
+		offlineAfter:  offlineAfter,
+	}
+}
+
+// SetEventBus sets the bus host status events are published on
+func (s *HostHeartbeatService) SetEventBus(events *EventBus) {
+	s.events = events
+	s.notifications.SetEventBus(events)
+}
+
+// Run checks for silent hosts every interval until ctx is cancelled
+func (s *HostHeartbeatService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Check(time.Now())
+		}
+	}
+}
+
+// Check marks hosts whose last report is older than the thresholds as degraded or
+// offline. Only hosts that have reported while approved are tracked, until they
+// are decommissioned.
+func (s *HostHeartbeatService) Check(now time.Time) {
+	var hosts []model.Host
+	err := s.db.Where("status IN ? AND last_seen_at < ? AND lifecycle NOT IN ?",
+		[]model.HostStatus{model.HostStatusOnline, model.HostStatusDegraded}, now.Add(-s.degradedAfter),
+		[]model.HostLifecycle{model.HostLifecycleDecommissioning, model.HostLifecycleRetired}).
+		Find(&hosts).Error
+	if err != nil {
+		s.logger.Error("failed to load hosts for heartbeat check", zap.Error(err))
+		return
+	}
+
+	for i := range hosts {
+		host := &hosts[i]
+		to := model.HostStatusDegraded
+		if host.LastSeenAt.Before(now.Add(-s.offlineAfter)) {
+			to = model.HostStatusOffline
+		}
+		if host.Status == to {
+			continue
+		}
+		if _, err := s.Transition(host, to, now); err != nil {
+			s.logger.Error("failed to update host status",
+				zap.String("hostId", host.ID.String()),
+				zap.String("status", string(to)),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// Transition moves the host to status to and announces the change. The update only
+// applies while the host still has the status it was loaded with, so concurrent
+// checkers and agent reports announce each transition once. It reports whether the
+// transition was applied.
+func (s *HostHeartbeatService) Transition(host *model.Host, to model.HostStatus, now time.Time) (bool, error) {
+	from := host.Status
+	result := s.db.Model(&model.Host{}).
+		Where("id = ? AND status = ?", host.ID, from).
+		Updates(map[string]interface{}{
+			"status":            to,
+			"status_changed_at": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	host.Status = to
+	host.StatusChangedAt = &now
+
+	s.announce(host, from, now)
+	return true, nil
+}
+
+// announce records a system event for the transition, publishes it and notifies the
+// host's owner. Hosts in maintenance are not notified about.
+func (s *HostHeartbeatService) announce(host *model.Host, from model.HostStatus, now time.Time) {
+	var (
+		eventType model.EventType
+		kind      string
+		severity  string
+		priority  model.NotificationPriority
+		title     string
+	)
+	switch host.Status {
+	case model.HostStatusDegraded:
+		eventType, kind, severity, priority = model.EventHostDegraded, "host_degraded", "warning", model.NotificationPriorityMedium
+		title = fmt.Sprintf("Host %s is degraded", host.Hostname)
+	case model.HostStatusOffline:
+		eventType, kind, severity, priority = model.EventHostOffline, "host_down", "error", model.NotificationPriorityHigh
+		title = fmt.Sprintf("Host %s is offline", host.Hostname)
+	case model.HostStatusOnline:
+		eventType, kind, severity, priority = model.EventHostOnline, "host_up", "info", model.NotificationPriorityLow
+		title = fmt.Sprintf("Host %s is back online", host.Hostname)
+	default:
+		return
+	}
+
+	// For recoveries LastSeenAt is still the report before the silence
+	message := fmt.Sprintf("Host %s (%s) changed from %s to %s", host.Hostname, host.IPAddress, from, host.Status)
+	if host.LastSeenAt != nil {
+		message += fmt.Sprintf(" after %s without agent reports", now.Sub(*host.LastSeenAt).Round(time.Second))
+	}
+
+	metadata, _ := json.Marshal(map[string]string{
+		"previousStatus": string(from),
+		"status":         string(host.Status),
+	})
+	if err := s.db.Create(&model.Event{
+		ID:        uuid.New(),
+		ClusterID: host.ClusterID,
+		HostID:    &host.ID,
+		Type:      kind,
+		Severity:  severity,
+		Title:     title,
+		Message:   message,
+		Metadata:  string(metadata),
+	}).Error; err != nil {
+		s.logger.Error("failed to record host status event", zap.String("hostId", host.ID.String()), zap.Error(err))
+	}
+
+	s.logger.Info("host status changed",
+		zap.String("hostId", host.ID.String()),
+		zap.String("from", string(from)),
+		zap.String("to", string(host.Status)),
+	)
+
+	owner := hostOwner(host)
+	if owner == nil {
+		return
+	}
+
+	attrs := map[string]string{
+		"hostId":         host.ID.String(),
+		"osType":         host.OSType,
+		"previousStatus": string(from),
+	}
+	if host.ClusterID != nil {
+		attrs["clusterId"] = host.ClusterID.String()
+	}
+	s.events.Publish(*owner, eventType, attrs, host)
+
+	if host.Lifecycle == model.HostLifecycleMaintenance {
+		return
+	}
+	if _, err := s.notifications.CreateSourcedNotification(*owner, model.NotificationSourceHosts, model.NotificationTypeAlert, title, message, priority); err != nil {
+		s.logger.Error("failed to notify host status change", zap.String("hostId", host.ID.String()), zap.Error(err))
+	}
+}
+
+// hostOwner returns the user who registered the host, or who approved it for hosts
+// registered by their agent
+func hostOwner(host *model.Host) *uuid.UUID {
+	if host.RegisteredBy != nil && *host.RegisteredBy != uuid.Nil {
+		return host.RegisteredBy
+	}
+	return host.ApprovedBy
+}
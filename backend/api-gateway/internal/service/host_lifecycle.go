@@ -0,0 +1,364 @@
+// Package service provides the lifecycle of hosts and their decommissioning
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// hostLifecycleSilence is how long alerts of hosts out of service are silenced
+	// at a time; the alert engine silences them again while the host stays out
+	hostLifecycleSilence = 5 * time.Minute
+	// maxArchivedHostRecords bounds each kind of record a host archive keeps,
+	// latest first
+	maxArchivedHostRecords = 1000
+	// maxHostLifecycleReason bounds the reason given for a transition
+	maxHostLifecycleReason = 1000
+)
+
+// AnnotationHostLifecycle is set on alerts suppressed because their host is out
+// of service, to the host's lifecycle state
+const AnnotationHostLifecycle = "host_lifecycle"
+
+var (
+	// ErrInvalidHostLifecycle is returned for transitions a host cannot make
+	ErrInvalidHostLifecycle = errors.New("invalid host lifecycle transition")
+	// ErrHostLifecycleConflict is returned when the host changed state while it
+	// was being moved
+	ErrHostLifecycleConflict = errors.New("host lifecycle changed concurrently")
+	// ErrHostArchiveNotFound is returned when a host has no archive
+	ErrHostArchiveNotFound = errors.New("host archive not found")
+)
+
+// HostLifecycleService moves hosts through their lifecycle, recording every
+// transition. Hosts in maintenance have their alerts suppressed, and
+// decommissioning a host revokes its agent token and archives its history
+// before it retires.
+type HostLifecycleService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	events *EventBus
+}
+
+// NewHostLifecycleService creates a new host lifecycle service
+func NewHostLifecycleService(db *gorm.DB, logger *zap.Logger) *HostLifecycleService {
+	return &HostLifecycleService{db: db, logger: logger}
+}
+
+// SetEventBus sets the bus lifecycle transitions are published on
+func (s *HostLifecycleService) SetEventBus(events *EventBus) {
+	s.events = events
+}
+
+// Get returns the host's lifecycle state, the states it can move to and its
+// transitions
+func (s *HostLifecycleService) Get(ctx context.Context, hostID uuid.UUID) (*model.HostLifecycleResponse, error) {
+	host, err := s.load(ctx, hostID)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []model.HostLifecycleEvent
+	if err := s.db.WithContext(ctx).Where("host_id = ?", hostID).Order("created_at DESC").Find(&history).Error; err != nil {
+		return nil, err
+	}
+	return &model.HostLifecycleResponse{
+		Lifecycle:   host.Lifecycle,
+		Transitions: host.Lifecycle.Transitions(),
+		History:     history,
+	}, nil
+}
+
+// Transition moves the host to the requested state as userID. Hosts entering
+// maintenance have their firing alerts silenced. Moving a host to
+// decommissioning or retired decommissions it, which ends with it retired.
+func (s *HostLifecycleService) Transition(ctx context.Context, userID, hostID uuid.UUID, req *model.HostLifecycleRequest) (*model.Host, error) {
+	if !req.Lifecycle.Valid() {
+		return nil, fmt.Errorf("%w: unknown state %q", ErrInvalidHostLifecycle, req.Lifecycle)
+	}
+	if len(req.Reason) > maxHostLifecycleReason {
+		return nil, fmt.Errorf("%w: reason must be at most %d characters", ErrInvalidHostLifecycle, maxHostLifecycleReason)
+	}
+	host, err := s.load(ctx, hostID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.Lifecycle {
+	case model.HostLifecycleDecommissioning, model.HostLifecycleRetired:
+		return s.Decommission(ctx, &userID, host, req.Reason)
+	}
+	if !host.Lifecycle.CanTransition(req.Lifecycle) {
+		return nil, fmt.Errorf("%w: %s hosts cannot move to %s", ErrInvalidHostLifecycle, host.Lifecycle, req.Lifecycle)
+	}
+
+	from := host.Lifecycle
+	if err := s.move(s.db.WithContext(ctx), host, req.Lifecycle, &userID, req.Reason, nil); err != nil {
+		return nil, err
+	}
+	s.announce(host, from, &userID)
+
+	if req.Lifecycle == model.HostLifecycleMaintenance {
+		if err := s.silenceAlerts(ctx, host); err != nil {
+			s.logger.Error("failed to silence alerts of host in maintenance", zap.String("hostId", host.ID.String()), zap.Error(err))
+		}
+	}
+	return host, nil
+}
+
+// Activate moves a provisioning host to active once its agent reports
+func (s *HostLifecycleService) Activate(host *model.Host) error {
+	from := host.Lifecycle
+	err := s.move(s.db, host, model.HostLifecycleActive, nil, "agent reported", nil)
+	if errors.Is(err, ErrHostLifecycleConflict) {
+		// Another report activated it first
+		return nil
+	} else if err != nil {
+		return err
+	}
+	s.announce(host, from, nil)
+	return nil
+}
+
+// Decommission takes the host out of service as userID: it revokes the host's
+// agent token, takes it offline, fails its unfinished agent commands, disables
+// the alert rules on it, resolves its open alerts, then retires it and archives
+// its history. A host left decommissioning by a failure resumes where it stopped.
+func (s *HostLifecycleService) Decommission(ctx context.Context, userID *uuid.UUID, host *model.Host, reason string) (*model.Host, error) {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+
+	if host.Lifecycle != model.HostLifecycleDecommissioning {
+		if !host.Lifecycle.CanTransition(model.HostLifecycleDecommissioning) {
+			return nil, fmt.Errorf("%w: %s hosts cannot be decommissioned", ErrInvalidHostLifecycle, host.Lifecycle)
+		}
+		// Its agent being refused from now on, the host goes offline
+		updates := map[string]interface{}{"agent_token_revoked_at": now}
+		switch host.Status {
+		case model.HostStatusApproved, model.HostStatusOnline, model.HostStatusDegraded:
+			updates["status"] = model.HostStatusOffline
+			updates["status_changed_at"] = now
+		}
+		from := host.Lifecycle
+		if err := s.move(db, host, model.HostLifecycleDecommissioning, userID, reason, updates); err != nil {
+			return nil, err
+		}
+		if _, ok := updates["status"]; ok {
+			host.Status = model.HostStatusOffline
+			host.StatusChangedAt = &now
+		}
+		host.AgentTokenRevokedAt = &now
+		s.announce(host, from, userID)
+	}
+
+	// Decommissioning hosts refuse their agent, which would never finish these
+	if err := db.Model(&model.AgentCommand{}).
+		Where("host_id = ? AND status IN ?", host.ID, []model.AgentCommandStatus{model.AgentCommandStatusPending, model.AgentCommandStatusDispatched}).
+		Updates(map[string]interface{}{
+			"status":        model.AgentCommandStatusFailed,
+			"error_message": "host decommissioned",
+			"completed_at":  now,
+		}).Error; err != nil {
+		return nil, fmt.Errorf("failed to fail agent commands: %w", err)
+	}
+	if err := db.Model(&model.AlertRule{}).
+		Where("target_type = ? AND target_id = ?", "host", host.ID.String()).
+		Update("enabled", false).Error; err != nil {
+		return nil, fmt.Errorf("failed to disable alert rules: %w", err)
+	}
+	if err := db.Model(&model.Alert{}).
+		Where("host_id = ? AND status IN ?", host.ID, []model.AlertStatus{model.AlertStatusPending, model.AlertStatusFiring, model.AlertStatusSilenced}).
+		Updates(map[string]interface{}{
+			"status":      model.AlertStatusResolved,
+			"resolved_at": now,
+		}).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve alerts: %w", err)
+	}
+
+	// The host only retires along with its archive
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := s.move(tx, host, model.HostLifecycleRetired, userID, reason, nil); err != nil {
+			return err
+		}
+		return s.archive(tx, userID, host)
+	})
+	if err != nil {
+		host.Lifecycle = model.HostLifecycleDecommissioning
+		return nil, err
+	}
+	s.announce(host, model.HostLifecycleDecommissioning, userID)
+	return host, nil
+}
+
+// ListArchives returns a page of host archives, latest first, without their history
+func (s *HostLifecycleService) ListArchives(ctx context.Context, page, pageSize int) ([]model.HostArchive, int64, error) {
+	db := s.db.WithContext(ctx).Model(&model.HostArchive{})
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var archives []model.HostArchive
+	err := db.Omit("history").Order("archived_at DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&archives).Error
+	return archives, total, err
+}
+
+// GetArchive returns the archive of a host
+func (s *HostLifecycleService) GetArchive(ctx context.Context, hostID uuid.UUID) (*model.HostArchive, error) {
+	var archive model.HostArchive
+	if err := s.db.WithContext(ctx).First(&archive, "host_id = ?", hostID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrHostArchiveNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// load returns a host
+func (s *HostLifecycleService) load(ctx context.Context, hostID uuid.UUID) (*model.Host, error) {
+	var host model.Host
+	if err := s.db.WithContext(ctx).First(&host, "id = ?", hostID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAgentHostNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &host, nil
+}
+
+// move moves the host to state to along with updates and records the
+// transition. The update only applies while the host is still in the state it
+// was loaded in, so concurrent transitions are recorded once.
+func (s *HostLifecycleService) move(db *gorm.DB, host *model.Host, to model.HostLifecycle, userID *uuid.UUID, reason string, updates map[string]interface{}) error {
+	from := host.Lifecycle
+	now := time.Now()
+	if updates == nil {
+		updates = map[string]interface{}{}
+	}
+	updates["lifecycle"] = to
+	updates["lifecycle_changed_at"] = now
+
+	result := db.Model(&model.Host{}).Where("id = ? AND lifecycle = ?", host.ID, from).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrHostLifecycleConflict
+	}
+	host.Lifecycle = to
+	host.LifecycleChangedAt = &now
+
+	return db.Create(&model.HostLifecycleEvent{
+		HostID: host.ID,
+		From:   from,
+		To:     to,
+		Reason: reason,
+		UserID: userID,
+	}).Error
+}
+
+// announce logs a transition and publishes it to the host's owner, or to the
+// user who moved it for hosts without one
+func (s *HostLifecycleService) announce(host *model.Host, from model.HostLifecycle, userID *uuid.UUID) {
+	s.logger.Info("host lifecycle changed",
+		zap.String("hostId", host.ID.String()),
+		zap.String("from", string(from)),
+		zap.String("to", string(host.Lifecycle)),
+	)
+
+	owner := hostOwner(host)
+	if owner == nil {
+		owner = userID
+	}
+	if owner == nil {
+		return
+	}
+	attrs := map[string]string{
+		"hostId":            host.ID.String(),
+		"lifecycle":         string(host.Lifecycle),
+		"previousLifecycle": string(from),
+	}
+	if host.ClusterID != nil {
+		attrs["clusterId"] = host.ClusterID.String()
+	}
+	s.events.Publish(*owner, model.EventHostLifecycle, attrs, host)
+}
+
+// silenceAlerts silences the host's firing alerts. The alert engine keeps them
+// silenced for as long as the host stays in maintenance.
+func (s *HostLifecycleService) silenceAlerts(ctx context.Context, host *model.Host) error {
+	db := s.db.WithContext(ctx)
+	var alerts []model.Alert
+	if err := db.Where("host_id = ? AND status = ?", host.ID, model.AlertStatusFiring).Find(&alerts).Error; err != nil {
+		return err
+	}
+
+	until := time.Now().Add(hostLifecycleSilence)
+	for i := range alerts {
+		suppressHostAlert(&alerts[i], host.Lifecycle, until)
+		if err := db.Save(&alerts[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archive writes the history of the host into its archive, replacing an
+// earlier one
+func (s *HostLifecycleService) archive(db *gorm.DB, userID *uuid.UUID, host *model.Host) error {
+	history := model.HostArchiveHistory{Host: *host}
+	if err := db.Where("host_id = ?", host.ID).Order("created_at").Find(&history.Lifecycle).Error; err != nil {
+		return err
+	}
+	if err := db.Where("host_id = ?", host.ID).Order("created_at DESC").Limit(maxArchivedHostRecords).Find(&history.Commands).Error; err != nil {
+		return err
+	}
+	if err := db.Where("host_id = ?", host.ID).Order("started_at DESC").Limit(maxArchivedHostRecords).Find(&history.Alerts).Error; err != nil {
+		return err
+	}
+	if err := db.Where("host_id = ?", host.ID).Order("created_at DESC").Limit(maxArchivedHostRecords).Find(&history.Events).Error; err != nil {
+		return err
+	}
+	data, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("failed to encode host history: %w", err)
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "host_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hostname", "ip_address", "agent_token_hash", "history", "archived_by", "archived_at"}),
+	}).Create(&model.HostArchive{
+		HostID:         host.ID,
+		Hostname:       host.Hostname,
+		IPAddress:      host.IPAddress,
+		AgentTokenHash: host.AgentTokenHash,
+		History:        data,
+		ArchivedBy:     userID,
+		ArchivedAt:     time.Now(),
+	}).Error
+}
+
+// suppressHostAlert silences an alert until then because its host is out of service
+func suppressHostAlert(alert *model.Alert, lifecycle model.HostLifecycle, until time.Time) {
+	annotations := map[string]string{}
+	if alert.Annotations != "" {
+		json.Unmarshal([]byte(alert.Annotations), &annotations)
+	}
+	annotations[AnnotationHostLifecycle] = string(lifecycle)
+	data, _ := json.Marshal(annotations)
+
+	alert.Status = model.AlertStatusSilenced
+	alert.SilencedUntil = &until
+	alert.Annotations = string(data)
+}
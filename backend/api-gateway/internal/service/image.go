@@ -0,0 +1,498 @@
+// Package service provides container image inventory and registry inspection
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// imageCacheTTL is how long what a registry reported for an image is reused
+	imageCacheTTL = 10 * time.Minute
+	// imageResolveConcurrency is how many images one inventory looks up at a time
+	imageResolveConcurrency = 8
+	// maxResolvedImages caps the images one inventory looks up in registries
+	maxResolvedImages = 200
+)
+
+var (
+	// ErrInvalidImage is returned for image names that cannot be parsed
+	ErrInvalidImage = errors.New("invalid image")
+	// ErrImageNotFound is returned when the registry does not have the image
+	ErrImageNotFound = errors.New("image not found")
+	// ErrRegistryUnauthorized is returned when the registry refuses the credentials
+	ErrRegistryUnauthorized = errors.New("registry authentication failed")
+	// ErrRegistryUnavailable is returned when the registry cannot be reached
+	ErrRegistryUnavailable = errors.New("registry unavailable")
+	// ErrInvalidContainerRegistry is returned when a registry's configuration is malformed
+	ErrInvalidContainerRegistry = errors.New("invalid container registry")
+	// ErrContainerRegistryNotFound is returned when the registry does not exist
+	ErrContainerRegistryNotFound = errors.New("container registry not found")
+)
+
+// ImageService lists the images deployments and pods run across clusters, flags
+// the ones referenced by :latest or without a digest, and looks images up in their
+// registry with the credentials configured for it
+type ImageService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	fanout *ClusterFanoutService
+
+	mu    sync.Mutex
+	cache map[string]cachedImage // By full image reference
+}
+
+// cachedImage is what a registry reported for an image and when
+type cachedImage struct {
+	detail *model.ImageDetail
+	at     time.Time
+}
+
+// NewImageService creates a new image service
+func NewImageService(db *gorm.DB, logger *zap.Logger, fanout *ClusterFanoutService) *ImageService {
+	return &ImageService{db: db, logger: logger, fanout: fanout, cache: make(map[string]cachedImage)}
+}
+
+// ============== Inventory ==============
+
+// Inventory lists the images running on the requested clusters, or every cluster the
+// user can see, grouped by image with the workloads running each. Clusters are
+// listed through the fan-out query, so the user only sees namespaces they may.
+func (s *ImageService) Inventory(ctx context.Context, userID uuid.UUID, req *model.ImageInventoryRequest) (*model.ImageInventory, error) {
+	resp, err := s.fanout.Query(ctx, userID, &model.ClusterFanoutRequest{
+		ClusterIDs: req.ClusterIDs,
+		Resource:   model.FanoutResourceImages,
+		Namespace:  req.Namespace,
+		Limit:      maxFanoutLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := &model.ImageInventory{
+		Images:    []model.ImageSummary{},
+		Truncated: resp.Truncated,
+		Clusters:  resp.Clusters,
+		Failed:    resp.Failed,
+	}
+	byImage := make(map[string]*model.ImageSummary)
+	var order []string
+	for _, item := range resp.Items {
+		image, ok := item.Object.(k8s.WorkloadImage)
+		if !ok {
+			continue
+		}
+		summary, ok := byImage[image.Image]
+		if !ok {
+			ref, err := parseImageReference(image.Image)
+			summary = &model.ImageSummary{Image: image.Image, Reference: ref, Findings: referenceFindings(ref)}
+			if err != nil {
+				summary.ResolveError = err.Error()
+			}
+			byImage[image.Image] = summary
+			order = append(order, image.Image)
+		}
+		summary.Workloads = append(summary.Workloads, model.ImageWorkload{
+			ClusterID:   item.ClusterID,
+			ClusterName: item.ClusterName,
+			Namespace:   image.Namespace,
+			Kind:        image.Kind,
+			Name:        image.Name,
+			Container:   image.Container,
+			Init:        image.Init,
+			Digests:     image.Digests,
+		})
+	}
+	sort.Strings(order)
+
+	summaries := make([]*model.ImageSummary, 0, len(order))
+	for _, image := range order {
+		summaries = append(summaries, byImage[image])
+	}
+	if req.Resolve {
+		s.resolve(ctx, summaries)
+	}
+
+	for _, summary := range summaries {
+		for _, workload := range summary.Workloads {
+			if len(workloadFindings(summary, &workload)) > 0 {
+				inventory.Flagged++
+			}
+		}
+		inventory.Images = append(inventory.Images, *summary)
+	}
+	inventory.Total = len(inventory.Images)
+	return inventory, nil
+}
+
+// Findings lists the workload containers whose image references have findings
+func (s *ImageService) Findings(ctx context.Context, userID uuid.UUID, req *model.ImageInventoryRequest) ([]model.ImageFinding, *model.ImageInventory, error) {
+	inventory, err := s.Inventory(ctx, userID, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	findings := []model.ImageFinding{}
+	for i := range inventory.Images {
+		summary := &inventory.Images[i]
+		for _, workload := range summary.Workloads {
+			if types := workloadFindings(summary, &workload); len(types) > 0 {
+				findings = append(findings, model.ImageFinding{ImageWorkload: workload, Image: summary.Image, Findings: types})
+			}
+		}
+	}
+	return findings, inventory, nil
+}
+
+// resolve looks the images up in their registries, adding digest drift findings
+// for the workloads whose pods run another digest than the tag now points at
+func (s *ImageService) resolve(ctx context.Context, summaries []*model.ImageSummary) {
+	slots := make(chan struct{}, imageResolveConcurrency)
+	var wg sync.WaitGroup
+	for i, summary := range summaries {
+		if summary.ResolveError != "" {
+			continue
+		}
+		if i >= maxResolvedImages {
+			summary.ResolveError = fmt.Sprintf("not looked up: only the first %d images are", maxResolvedImages)
+			continue
+		}
+		wg.Add(1)
+		go func(summary *model.ImageSummary) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			detail, err := s.inspect(ctx, summary.Reference)
+			if err != nil {
+				summary.ResolveError = err.Error()
+				return
+			}
+			summary.Detail = detail
+			for _, workload := range summary.Workloads {
+				if digestDrifted(detail, workload.Digests) {
+					summary.Findings = append(summary.Findings, model.ImageFindingDigestDrift)
+					break
+				}
+			}
+		}(summary)
+	}
+	wg.Wait()
+}
+
+// referenceFindings flags an image reference that runs :latest or has no digest.
+// A digest pins the image whatever its tag says.
+func referenceFindings(ref model.ImageReference) []model.ImageFindingType {
+	findings := []model.ImageFindingType{}
+	if ref.Tag == "latest" && ref.Digest == "" {
+		findings = append(findings, model.ImageFindingLatestTag)
+	}
+	if ref.Digest == "" && ref.Repository != "" {
+		findings = append(findings, model.ImageFindingUnpinned)
+	}
+	return findings
+}
+
+// workloadFindings returns the findings of an image that apply to one workload:
+// digest drift only applies to workloads running another digest
+func workloadFindings(summary *model.ImageSummary, workload *model.ImageWorkload) []model.ImageFindingType {
+	var findings []model.ImageFindingType
+	for _, finding := range summary.Findings {
+		if finding == model.ImageFindingDigestDrift && !digestDrifted(summary.Detail, workload.Digests) {
+			continue
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// digestDrifted reports whether pods run a digest the image's tag no longer points
+// at, either as the index or as one of its platform images
+func digestDrifted(detail *model.ImageDetail, running []string) bool {
+	if detail == nil || detail.Reference.Digest != "" {
+		return false
+	}
+	current := map[string]bool{detail.Digest: true}
+	for _, platform := range detail.Platforms {
+		current[platform.Digest] = true
+	}
+	for _, digest := range running {
+		if !current[digest] {
+			return true
+		}
+	}
+	return false
+}
+
+// ============== Registry lookups ==============
+
+// Inspect looks an image up in its registry: its digest, size, labels and platforms
+func (s *ImageService) Inspect(ctx context.Context, image string) (*model.ImageDetail, error) {
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	return s.inspect(ctx, ref)
+}
+
+func (s *ImageService) inspect(ctx context.Context, ref model.ImageReference) (*model.ImageDetail, error) {
+	key := imageReferenceString(ref)
+	s.mu.Lock()
+	cached, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok && time.Since(cached.at) < imageCacheTTL {
+		return cached.detail, nil
+	}
+
+	client, registry, err := s.client(ctx, ref.Registry)
+	if err != nil {
+		return nil, err
+	}
+	detail, err := client.Inspect(ctx, ref)
+	if err != nil {
+		return nil, registryFailure(err)
+	}
+	if registry != nil {
+		detail.RegistryName = registry.Name
+	}
+
+	s.mu.Lock()
+	for k, v := range s.cache {
+		if time.Since(v.at) >= imageCacheTTL {
+			delete(s.cache, k)
+		}
+	}
+	s.cache[key] = cachedImage{detail: detail, at: time.Now()}
+	s.mu.Unlock()
+	return detail, nil
+}
+
+// Tags lists the tags of an image's repository
+func (s *ImageService) Tags(ctx context.Context, image string) (*model.ImageTags, error) {
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	client, _, err := s.client(ctx, ref.Registry)
+	if err != nil {
+		return nil, err
+	}
+	tags, truncated, err := client.Tags(ctx, ref.Repository)
+	if err != nil {
+		return nil, registryFailure(err)
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	sort.Strings(tags)
+	return &model.ImageTags{Reference: ref, Tags: tags, Truncated: truncated}, nil
+}
+
+// client creates a client for a registry host with the credentials configured for
+// it, if any
+func (s *ImageService) client(ctx context.Context, host string) (*registryClient, *model.ContainerRegistry, error) {
+	registry, err := s.registryFor(host)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := newRegistryClient(ctx, host, registry)
+	if err != nil {
+		return nil, nil, registryFailure(err)
+	}
+	return client, registry, nil
+}
+
+// registryFor returns the registry configured for a host, or nil when there is none
+func (s *ImageService) registryFor(host string) (*model.ContainerRegistry, error) {
+	var registries []model.ContainerRegistry
+	if err := s.db.Order("name").Find(&registries).Error; err != nil {
+		return nil, err
+	}
+	for i := range registries {
+		registry := &registries[i]
+		if registryHost(registry) == host || (host == dockerHubRegistry && registry.Type == model.RegistryDockerHub) {
+			return registry, nil
+		}
+	}
+	return nil, nil
+}
+
+// registryHost is the host images of a registry are named with
+func registryHost(registry *model.ContainerRegistry) string {
+	u, err := url.Parse(registry.URL)
+	if err != nil {
+		return ""
+	}
+	if u.Host == dockerHubAPIHost || u.Host == "index.docker.io" {
+		return dockerHubRegistry
+	}
+	return u.Host
+}
+
+// registryFailure classifies a registry client error
+func registryFailure(err error) error {
+	var re *registryError
+	if errors.As(err, &re) {
+		switch re.Status {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return fmt.Errorf("%w: %v", ErrRegistryUnauthorized, err)
+		case http.StatusNotFound:
+			return fmt.Errorf("%w: %v", ErrImageNotFound, err)
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrRegistryUnavailable, err)
+}
+
+// ============== Registries ==============
+
+// ListRegistries returns every configured registry
+func (s *ImageService) ListRegistries() ([]model.ContainerRegistry, error) {
+	var registries []model.ContainerRegistry
+	if err := s.db.Order("name").Find(&registries).Error; err != nil {
+		return nil, err
+	}
+	return registries, nil
+}
+
+// GetRegistry returns a registry
+func (s *ImageService) GetRegistry(id uuid.UUID) (*model.ContainerRegistry, error) {
+	var registry model.ContainerRegistry
+	if err := s.db.First(&registry, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrContainerRegistryNotFound
+		}
+		return nil, err
+	}
+	return &registry, nil
+}
+
+// CreateRegistry adds credentials for a registry
+func (s *ImageService) CreateRegistry(userID uuid.UUID, req *model.CreateContainerRegistryRequest) (*model.ContainerRegistry, error) {
+	registry := &model.ContainerRegistry{
+		CreatedBy:       userID,
+		Name:            strings.TrimSpace(req.Name),
+		Type:            req.Type,
+		URL:             strings.TrimSpace(req.URL),
+		Username:        req.Username,
+		Password:        req.Password,
+		Region:          strings.TrimSpace(req.Region),
+		InsecureSkipTLS: req.InsecureSkipTLS,
+	}
+	if registry.URL == "" && registry.Type == model.RegistryDockerHub {
+		registry.URL = "https://" + dockerHubAPIHost
+	}
+	if err := validateContainerRegistry(registry); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(registry).Error; err != nil {
+		return nil, err
+	}
+	s.flush()
+	return registry, nil
+}
+
+// UpdateRegistry changes the given fields of a registry
+func (s *ImageService) UpdateRegistry(id uuid.UUID, req *model.UpdateContainerRegistryRequest) (*model.ContainerRegistry, error) {
+	registry, err := s.GetRegistry(id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		registry.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.URL != nil {
+		registry.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.Username != nil {
+		registry.Username = *req.Username
+	}
+	if req.Password != nil {
+		registry.Password = *req.Password
+	}
+	if req.Region != nil {
+		registry.Region = strings.TrimSpace(*req.Region)
+	}
+	if req.InsecureSkipTLS != nil {
+		registry.InsecureSkipTLS = *req.InsecureSkipTLS
+	}
+	if err := validateContainerRegistry(registry); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(registry).Error; err != nil {
+		return nil, err
+	}
+	s.flush()
+	return registry, nil
+}
+
+// DeleteRegistry removes a registry's credentials
+func (s *ImageService) DeleteRegistry(id uuid.UUID) error {
+	result := s.db.Delete(&model.ContainerRegistry{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrContainerRegistryNotFound
+	}
+	s.flush()
+	return nil
+}
+
+// TestRegistry authenticates to a registry's V2 API with its credentials
+func (s *ImageService) TestRegistry(ctx context.Context, id uuid.UUID) error {
+	registry, err := s.GetRegistry(id)
+	if err != nil {
+		return err
+	}
+	client, err := newRegistryClient(ctx, registryHost(registry), registry)
+	if err != nil {
+		return registryFailure(err)
+	}
+	resp, err := client.get(ctx, "", "/v2/")
+	if err != nil {
+		return registryFailure(err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// flush forgets what registries reported, after their credentials changed
+func (s *ImageService) flush() {
+	s.mu.Lock()
+	s.cache = make(map[string]cachedImage)
+	s.mu.Unlock()
+}
+
+// validateContainerRegistry checks a registry's type, URL and credentials
+func validateContainerRegistry(registry *model.ContainerRegistry) error {
+	if registry.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidContainerRegistry)
+	}
+	switch registry.Type {
+	case model.RegistryDockerHub, model.RegistryHarbor:
+	case model.RegistryECR:
+		if registry.Username == "" || registry.Password == "" {
+			return fmt.Errorf("%w: ECR registries need an AWS access key ID and secret", ErrInvalidContainerRegistry)
+		}
+	default:
+		return fmt.Errorf("%w: type must be dockerhub, harbor or ecr", ErrInvalidContainerRegistry)
+	}
+	if u, err := url.Parse(registry.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an http(s) URL", ErrInvalidContainerRegistry)
+	}
+	if registry.Type == model.RegistryECR && registry.Region == "" && !ecrHostPattern.MatchString(registryHost(registry)) {
+		return fmt.Errorf("%w: region is required for ECR registries outside amazonaws.com", ErrInvalidContainerRegistry)
+	}
+	return nil
+}
@@ -0,0 +1,554 @@
+// Package service provides the background job queue shared by the gateway instances
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Job queue settings
+const (
+	jobPollInterval         = 5 * time.Second
+	jobPruneInterval        = time.Hour
+	defaultJobMaxAttempts   = 5
+	defaultJobVisibility    = 5 * time.Minute
+	defaultJobRetryBase     = 30 * time.Second
+	defaultJobRetryMax      = time.Hour
+	jobErrorChars           = 2000
+	defaultJobWorkerCount   = 4
+	jobClaimFailureCooldown = 10 * time.Second
+)
+
+var (
+	// ErrJobNotFound is returned for jobs that do not exist
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobNotDead is returned when requeueing a job that did not run out of attempts
+	ErrJobNotDead = errors.New("job is not dead")
+	// ErrJobRunning is returned when deleting a job an attempt is running for
+	ErrJobRunning = errors.New("job is running")
+	// ErrUnknownJobType is returned when enqueueing a job no worker is registered for
+	ErrUnknownJobType = errors.New("unknown job type")
+)
+
+// JobHandler runs one attempt of a job. The context ends with the job's visibility
+// timeout, after which another worker may claim the job again. An error schedules
+// a retry, unless the job is out of attempts.
+type JobHandler func(ctx context.Context, job *model.Job) error
+
+// JobTypeOptions configure the jobs of a type. Zero values take the defaults.
+type JobTypeOptions struct {
+	MaxAttempts       int
+	VisibilityTimeout time.Duration // How long an attempt may run before the job is claimed again
+	RetryBase         time.Duration // Delay before the first retry, doubled after each failure
+	RetryMax          time.Duration
+}
+
+// JobOptions configure one enqueued job
+type JobOptions struct {
+	Priority    int
+	Delay       time.Duration // Run no sooner than this from now
+	MaxAttempts int           // Overrides the job type's
+}
+
+// jobType is a registered job type with its metrics
+type jobType struct {
+	handler JobHandler
+	options JobTypeOptions
+
+	enqueued   atomic.Int64
+	attempts   atomic.Int64
+	failures   atomic.Int64
+	durationMs atomic.Int64
+}
+
+// JobQueue is a database-backed queue of background work. Each instance runs
+// the jobs of the types registered with it; a job is claimed by one worker at a
+// time, for the visibility timeout of its type.
+type JobQueue struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	settings *SettingsService
+	instance string
+
+	mu    sync.RWMutex
+	types map[string]*jobType
+
+	wake chan struct{}
+}
+
+// NewJobQueue creates a new job queue
+func NewJobQueue(db *gorm.DB, logger *zap.Logger, settings *SettingsService) *JobQueue {
+	hostname, _ := os.Hostname()
+	return &JobQueue{
+		db:       db,
+		logger:   logger,
+		settings: settings,
+		instance: fmt.Sprintf("%s-%s", hostname, uuid.NewString()[:8]),
+		types:    make(map[string]*jobType),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Register sets the handler of a job type. Types are registered before Run.
+func (q *JobQueue) Register(name string, handler JobHandler, options JobTypeOptions) {
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaultJobMaxAttempts
+	}
+	if options.VisibilityTimeout <= 0 {
+		options.VisibilityTimeout = defaultJobVisibility
+	}
+	if options.RetryBase <= 0 {
+		options.RetryBase = defaultJobRetryBase
+	}
+	if options.RetryMax <= 0 {
+		options.RetryMax = defaultJobRetryMax
+	}
+	q.mu.Lock()
+	q.types[name] = &jobType{handler: handler, options: options}
+	q.mu.Unlock()
+}
+
+// jobType returns a registered job type
+func (q *JobQueue) jobType(name string) *jobType {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.types[name]
+}
+
+// registeredTypes returns the names of the registered job types
+func (q *JobQueue) registeredTypes() []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	names := make([]string, 0, len(q.types))
+	for name := range q.types {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Enqueue queues a job of a registered type with its payload encoded as JSON
+func (q *JobQueue) Enqueue(name string, payload interface{}, options JobOptions) (*model.Job, error) {
+	jt := q.jobType(name)
+	if jt == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJobType, name)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+	maxAttempts := options.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = jt.options.MaxAttempts
+	}
+
+	job := model.Job{
+		ID:          uuid.New(),
+		Type:        name,
+		Priority:    options.Priority,
+		Payload:     data,
+		Status:      model.JobQueued,
+		MaxAttempts: maxAttempts,
+		RunAt:       time.Now().Add(options.Delay),
+	}
+	if err := q.db.Create(&job).Error; err != nil {
+		return nil, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	jt.enqueued.Add(1)
+	if options.Delay <= 0 {
+		q.notify()
+	}
+	return &job, nil
+}
+
+// notify wakes an idle worker of this instance
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run runs the workers of this instance, as many as the jobs.workers setting,
+// and prunes succeeded jobs past the retention setting, until ctx is cancelled.
+// Attempts still running then are cancelled and retried.
+func (q *JobQueue) Run(ctx context.Context) {
+	workers := q.settings.Int(model.SettingJobWorkers)
+	if workers <= 0 {
+		workers = defaultJobWorkerCount
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(jobPruneInterval)
+	defer ticker.Stop()
+	for {
+		if deleted, err := q.Prune(); err != nil {
+			q.logger.Error("failed to prune jobs", zap.Error(err))
+		} else if deleted > 0 {
+			q.logger.Info("pruned jobs", zap.Int64("deleted", deleted))
+		}
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// work claims and runs jobs until ctx is cancelled, waiting for the poll
+// interval or an enqueue whenever the queue has nothing due
+func (q *JobQueue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := q.claim()
+		if err != nil {
+			q.logger.Error("failed to claim job", zap.Error(err))
+			sleepContext(ctx, jobClaimFailureCooldown)
+			continue
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-q.wake:
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+		q.run(ctx, job)
+	}
+}
+
+// sleepContext waits for d or the end of ctx
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// claim locks the next due job of a registered type for this instance: queued
+// jobs past their run time by priority, and running jobs whose visibility
+// timeout expired. It returns nil when nothing is due.
+func (q *JobQueue) claim() (*model.Job, error) {
+	names := q.registeredTypes()
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var claimed *model.Job
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var due []model.Job
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("type IN ?", names).
+			Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_until < ?)",
+				model.JobQueued, now, model.JobRunning, now).
+			Order("priority DESC, run_at").
+			Limit(1).Find(&due).Error; err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+		job := due[0]
+
+		// An attempt that outlived its visibility timeout counts as failed
+		if job.Status == model.JobRunning && job.Attempts >= job.MaxAttempts {
+			q.jobType(job.Type).failures.Add(1)
+			return tx.Model(&model.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+				"status":       model.JobDead,
+				"last_error":   "attempt exceeded the visibility timeout",
+				"locked_until": nil,
+				"locked_by":    "",
+				"completed_at": now,
+			}).Error
+		}
+
+		attempts := job.Attempts + 1
+		lockedUntil := now.Add(q.jobType(job.Type).options.VisibilityTimeout)
+		if err := tx.Model(&model.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status":       model.JobRunning,
+			"attempts":     attempts,
+			"locked_until": lockedUntil,
+			"locked_by":    q.instance,
+		}).Error; err != nil {
+			return err
+		}
+		job.Status = model.JobRunning
+		job.Attempts = attempts
+		job.LockedUntil = &lockedUntil
+		job.LockedBy = q.instance
+		claimed = &job
+		return nil
+	})
+	return claimed, err
+}
+
+// run runs one attempt of a claimed job and records how it ended: succeeded,
+// queued again with backoff, or dead once out of attempts
+func (q *JobQueue) run(ctx context.Context, job *model.Job) {
+	jt := q.jobType(job.Type)
+	start := time.Now()
+	attemptCtx, cancel := context.WithTimeout(ctx, jt.options.VisibilityTimeout)
+	err := func() (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				q.logger.Error("job panicked", zap.String("jobId", job.ID.String()), zap.String("type", job.Type),
+					zap.Any("error", p), zap.String("stack", string(debug.Stack())))
+				err = fmt.Errorf("job panicked: %v", p)
+			}
+		}()
+		return jt.handler(attemptCtx, job)
+	}()
+	cancel()
+
+	duration := time.Since(start).Milliseconds()
+	jt.attempts.Add(1)
+	jt.durationMs.Add(duration)
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"duration_ms":  duration,
+		"locked_until": nil,
+		"locked_by":    "",
+	}
+	switch {
+	case err == nil:
+		updates["status"] = model.JobSucceeded
+		updates["last_error"] = ""
+		updates["completed_at"] = now
+	case job.Attempts >= job.MaxAttempts:
+		jt.failures.Add(1)
+		updates["status"] = model.JobDead
+		updates["last_error"] = truncateJobError(err)
+		updates["completed_at"] = now
+		q.logger.Warn("job is dead", zap.String("jobId", job.ID.String()), zap.String("type", job.Type),
+			zap.Int("attempts", job.Attempts), zap.Error(err))
+	default:
+		jt.failures.Add(1)
+		updates["status"] = model.JobQueued
+		updates["last_error"] = truncateJobError(err)
+		updates["run_at"] = now.Add(jobBackoff(jt.options, job.Attempts))
+	}
+
+	// An attempt that timed out may have been claimed again meanwhile
+	result := q.db.Model(&model.Job{}).
+		Where("id = ? AND status = ? AND locked_by = ? AND attempts = ?", job.ID, model.JobRunning, q.instance, job.Attempts).
+		Updates(updates)
+	if result.Error != nil {
+		q.logger.Error("failed to record job attempt", zap.String("jobId", job.ID.String()), zap.Error(result.Error))
+	}
+}
+
+// truncateJobError returns the message of err, cut to fit the job record
+func truncateJobError(err error) string {
+	message := err.Error()
+	if len(message) > jobErrorChars {
+		message = message[:jobErrorChars]
+	}
+	return message
+}
+
+// jobBackoff doubles the retry delay of a job type after each failed attempt,
+// up to its maximum
+func jobBackoff(options JobTypeOptions, attempts int) time.Duration {
+	delay := options.RetryBase
+	for i := 1; i < attempts && delay < options.RetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, options.RetryMax)
+}
+
+// Get returns a job
+func (q *JobQueue) Get(id uuid.UUID) (*model.Job, error) {
+	var job model.Job
+	if err := q.db.Where("id = ?", id).First(&job).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJobNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// List returns a page of jobs, most recently updated first, and their total
+func (q *JobQueue) List(filter model.JobFilter, page, pageSize int) ([]model.Job, int64, error) {
+	query := q.db.Model(&model.Job{})
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	jobs := []model.Job{}
+	if err := query.Order("updated_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&jobs).Error; err != nil {
+		return nil, 0, err
+	}
+	return jobs, total, nil
+}
+
+// Requeue queues a dead job to run again now with a fresh set of attempts
+func (q *JobQueue) Requeue(id uuid.UUID) (*model.Job, error) {
+	result := q.db.Model(&model.Job{}).
+		Where("id = ? AND status = ?", id, model.JobDead).
+		Updates(requeueUpdates())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := q.Get(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrJobNotDead
+	}
+	q.notify()
+	return q.Get(id)
+}
+
+// RequeueDead queues every dead job of a type, or every dead job when jobType
+// is empty, returning the number requeued
+func (q *JobQueue) RequeueDead(jobType string) (int64, error) {
+	query := q.db.Model(&model.Job{}).Where("status = ?", model.JobDead)
+	if jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+	result := query.Updates(requeueUpdates())
+	if result.RowsAffected > 0 {
+		q.notify()
+	}
+	return result.RowsAffected, result.Error
+}
+
+// requeueUpdates are the updates that queue a dead job again
+func requeueUpdates() map[string]interface{} {
+	return map[string]interface{}{
+		"status":       model.JobQueued,
+		"attempts":     0,
+		"run_at":       time.Now(),
+		"completed_at": nil,
+	}
+}
+
+// Delete deletes a job that is not running
+func (q *JobQueue) Delete(id uuid.UUID) error {
+	result := q.db.Where("id = ? AND status <> ?", id, model.JobRunning).Delete(&model.Job{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := q.Get(id); err != nil {
+			return err
+		}
+		return ErrJobRunning
+	}
+	return nil
+}
+
+// Stats returns the metrics of each job type in the queue or registered with
+// this instance, by type name
+func (q *JobQueue) Stats() ([]model.JobTypeStats, error) {
+	var counts []struct {
+		Type   string
+		Status model.JobStatus
+		Count  int64
+	}
+	if err := q.db.Model(&model.Job{}).Select("type, status, COUNT(*) AS count").
+		Group("type, status").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	var oldest []struct {
+		Type   string
+		Oldest time.Time
+	}
+	if err := q.db.Model(&model.Job{}).Select("type, MIN(run_at) AS oldest").
+		Where("status = ? AND run_at <= ?", model.JobQueued, time.Now()).
+		Group("type").Scan(&oldest).Error; err != nil {
+		return nil, err
+	}
+
+	byType := make(map[string]*model.JobTypeStats)
+	stats := func(name string) *model.JobTypeStats {
+		if s, ok := byType[name]; ok {
+			return s
+		}
+		s := &model.JobTypeStats{Type: name}
+		byType[name] = s
+		return s
+	}
+	for _, c := range counts {
+		s := stats(c.Type)
+		switch c.Status {
+		case model.JobQueued:
+			s.Queued = c.Count
+		case model.JobRunning:
+			s.Running = c.Count
+		case model.JobSucceeded:
+			s.Succeeded = c.Count
+		case model.JobDead:
+			s.Dead = c.Count
+		}
+	}
+	for _, o := range oldest {
+		at := o.Oldest
+		stats(o.Type).OldestQueuedAt = &at
+	}
+
+	q.mu.RLock()
+	for name, jt := range q.types {
+		s := stats(name)
+		s.Registered = true
+		s.Enqueued = jt.enqueued.Load()
+		s.Attempts = jt.attempts.Load()
+		s.Failures = jt.failures.Load()
+		if s.Attempts > 0 {
+			s.AvgDurationMs = float64(jt.durationMs.Load()) / float64(s.Attempts)
+		}
+	}
+	q.mu.RUnlock()
+
+	result := make([]model.JobTypeStats, 0, len(byType))
+	for _, s := range byType {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Type < result[j].Type })
+	return result, nil
+}
+
+// Prune deletes succeeded jobs older than the retention setting, returning the
+// number deleted. Dead jobs are kept for requeueing.
+func (q *JobQueue) Prune() (int64, error) {
+	retention := q.settings.Duration(model.SettingJobRetention)
+	if retention <= 0 {
+		return 0, nil
+	}
+	result := q.db.Where("status = ? AND completed_at < ?", model.JobSucceeded, time.Now().Add(-retention)).
+		Delete(&model.Job{})
+	return result.RowsAffected, result.Error
+}
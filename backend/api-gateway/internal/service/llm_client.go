@@ -0,0 +1,152 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// LLMClient calls an OpenAI-compatible chat completion API
+type LLMClient struct {
+	mu           sync.RWMutex
+	baseURL      string
+	apiKey       string
+	defaultModel string
+	http         *http.Client
+}
+
+// NewLLMClient creates an LLM client. It returns nil when baseURL is empty, which
+// callers treat as the LLM being unconfigured.
+func NewLLMClient(baseURL, apiKey, defaultModel string, timeout time.Duration) *LLMClient {
+	if baseURL == "" {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	return &LLMClient{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		apiKey:       apiKey,
+		defaultModel: defaultModel,
+		http:         &http.Client{Timeout: timeout},
+	}
+}
+
+// Configure replaces the provider settings of the client. Empty values keep the
+// current ones.
+func (c *LLMClient) Configure(baseURL, apiKey, defaultModel string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if baseURL != "" {
+		c.baseURL = strings.TrimRight(baseURL, "/")
+	}
+	if apiKey != "" {
+		c.apiKey = apiKey
+	}
+	if defaultModel != "" {
+		c.defaultModel = defaultModel
+	}
+}
+
+// LLMCompletion is the reply to a chat request. ToolCalls is set when the model asks
+// for tools to be run before it answers.
+type LLMCompletion struct {
+	Content          string
+	ToolCalls        []model.LLMToolCall
+	TokensUsed       int
+	PromptTokens     int
+	CompletionTokens int
+	Model            string
+}
+
+type chatCompletionRequest struct {
+	Model       string                    `json:"model"`
+	Messages    []model.LLMChatMessage    `json:"messages"`
+	Temperature float64                   `json:"temperature"`
+	MaxTokens   int                       `json:"max_tokens,omitempty"`
+	Tools       []model.LLMToolDefinition `json:"tools,omitempty"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message model.LLMChatMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Chat sends the messages and returns the assistant's reply, offering tools when given.
+// An empty modelName uses the client's default model.
+func (c *LLMClient) Chat(ctx context.Context, modelName string, temperature float64, maxTokens int, messages []model.LLMChatMessage, tools []model.LLMToolDefinition) (*LLMCompletion, error) {
+	c.mu.RLock()
+	baseURL, apiKey := c.baseURL, c.apiKey
+	if modelName == "" {
+		modelName = c.defaultModel
+	}
+	c.mu.RUnlock()
+
+	body, err := json.Marshal(chatCompletionRequest{
+		Model:       modelName,
+		Messages:    messages,
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
+		Tools:       tools,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("LLM request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LLM response: %w", err)
+	}
+	var completion chatCompletionResponse
+	if err := json.Unmarshal(data, &completion); err != nil {
+		return nil, fmt.Errorf("LLM returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data[:min(len(data), 512)])))
+	}
+	if completion.Error != nil {
+		return nil, fmt.Errorf("LLM error: %s", completion.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK || len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("LLM returned %d with no reply", resp.StatusCode)
+	}
+
+	return &LLMCompletion{
+		Content:          completion.Choices[0].Message.Content,
+		ToolCalls:        completion.Choices[0].Message.ToolCalls,
+		TokensUsed:       completion.Usage.TotalTokens,
+		PromptTokens:     completion.Usage.PromptTokens,
+		CompletionTokens: completion.Usage.CompletionTokens,
+		Model:            completion.Model,
+	}, nil
+}
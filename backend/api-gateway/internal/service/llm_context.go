@@ -0,0 +1,390 @@
+// Package service provides cluster context for LLM conversations
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// Context budget, in characters (roughly four per token)
+const (
+	DefaultLLMContextBudget = 6000
+	MaxLLMContextBudget     = 32000
+	minLLMContextBudget     = 500
+)
+
+// Limits on what each section gathers before budgeting
+const (
+	llmContextEventWindow  = time.Hour
+	llmContextEventLimit   = 50
+	llmContextAlertLimit   = 30
+	llmContextMessageChars = 300
+)
+
+// defaultLLMSystemPrompt is used when a conversation has no system prompt of its own
+const defaultLLMSystemPrompt = "You are an operations assistant for Kubernetes clusters and Linux hosts. " +
+	"Answer concisely, explain your reasoning, and prefer read-only diagnostic steps before suggesting changes."
+
+// ErrUnknownContextSection is returned when a requested context section does not exist
+var ErrUnknownContextSection = errors.New("unknown context section")
+
+// LLMContextBuilder gathers cluster state into a system context for LLM conversations
+type LLMContextBuilder struct {
+	db *gorm.DB
+}
+
+// NewLLMContextBuilder creates a new context builder
+func NewLLMContextBuilder(db *gorm.DB) *LLMContextBuilder {
+	return &LLMContextBuilder{db: db}
+}
+
+// contextSection is a rendered section before budgeting
+type contextSection struct {
+	name  string
+	title string
+	lines []string
+	err   string
+}
+
+// Build gathers the requested sections for the conversation's cluster, fits them into
+// budget characters and stores the result as a snapshot. It returns nil when the
+// conversation has no cluster. Sections that fail to load are recorded with their
+// error rather than failing the build.
+func (b *LLMContextBuilder) Build(ctx context.Context, conversation *model.LLMConversation, sections []string, budget int) (*model.LLMContextSnapshot, error) {
+	if len(sections) == 0 {
+		sections = model.LLMContextSections
+	}
+	wanted := map[string]bool{}
+	for _, name := range sections {
+		if !containsString(model.LLMContextSections, name) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownContextSection, name)
+		}
+		wanted[name] = true
+	}
+	if budget <= 0 {
+		budget = DefaultLLMContextBudget
+	}
+	budget = min(max(budget, minLLMContextBudget), MaxLLMContextBudget)
+
+	if conversation.ClusterID == nil {
+		return nil, nil
+	}
+	var cluster model.K8sCluster
+	if err := b.db.Where("id = ? AND user_id = ?", *conversation.ClusterID, conversation.UserID).First(&cluster).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// The cluster client is only needed for live sections; connect lazily
+	var client *k8s.ClusterClient
+	var clientErr error
+	connect := func() (*k8s.ClusterClient, error) {
+		if client == nil && clientErr == nil {
+			client, clientErr = k8s.NewClusterClient(&k8s.ClusterConfig{
+				Kubeconfig: []byte(cluster.Kubeconfig),
+				Endpoint:   cluster.Endpoint,
+			})
+		}
+		return client, clientErr
+	}
+
+	now := time.Now().UTC()
+	var rendered []contextSection
+	for _, name := range model.LLMContextSections {
+		if !wanted[name] {
+			continue
+		}
+		switch name {
+		case model.LLMContextCluster:
+			rendered = append(rendered, b.clusterSection(ctx, &cluster, connect))
+		case model.LLMContextAlerts:
+			rendered = append(rendered, b.alertSection(&cluster))
+		case model.LLMContextEvents:
+			rendered = append(rendered, b.eventSection(ctx, now, connect))
+		case model.LLMContextMetrics:
+			rendered = append(rendered, b.metricSection(&cluster, now))
+		}
+	}
+
+	preamble := fmt.Sprintf("Context for Kubernetes cluster %q, gathered at %s. "+
+		"It reflects the cluster state when this message was sent and may be incomplete.",
+		cluster.Name, now.Format(time.RFC3339))
+	content, summaries, truncated := fitContext(preamble, rendered, budget)
+
+	sectionsJSON, _ := json.Marshal(summaries)
+	size := utf8.RuneCountInString(content)
+	snapshot := &model.LLMContextSnapshot{
+		ConversationID:  conversation.ID,
+		ClusterID:       conversation.ClusterID,
+		Content:         content,
+		Sections:        string(sectionsJSON),
+		Budget:          budget,
+		Size:            size,
+		EstimatedTokens: (size + 3) / 4,
+		Truncated:       truncated,
+	}
+	if err := b.db.Create(snapshot).Error; err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (b *LLMContextBuilder) clusterSection(ctx context.Context, cluster *model.K8sCluster, connect func() (*k8s.ClusterClient, error)) contextSection {
+	section := contextSection{name: model.LLMContextCluster, title: "Cluster"}
+	section.lines = append(section.lines,
+		fmt.Sprintf("- name: %s (%s, status %s)", cluster.Name, cluster.Type, cluster.Status),
+		fmt.Sprintf("- kubernetes version: %s", valueOr(cluster.Version, "unknown")),
+	)
+	if cluster.Provider != "" || cluster.Region != "" {
+		section.lines = append(section.lines, fmt.Sprintf("- provider: %s, region: %s", valueOr(cluster.Provider, "unknown"), valueOr(cluster.Region, "unknown")))
+	}
+	if cluster.ErrorMessage != "" {
+		section.lines = append(section.lines, "- last connection error: "+truncateRunes(cluster.ErrorMessage, llmContextMessageChars))
+	}
+
+	client, err := connect()
+	if err == nil {
+		var info *k8s.ClusterInfo
+		if info, err = client.GetClusterInfo(ctx); err == nil {
+			section.lines = append(section.lines, fmt.Sprintf(
+				"- objects: %d nodes, %d namespaces, %d pods, %d deployments, %d services",
+				info.NodeCount, info.NamespaceCount, info.PodCount, info.DeploymentCount, info.ServiceCount))
+		}
+	}
+	if err != nil {
+		// Stored details are still useful when the cluster cannot be reached
+		section.lines = append(section.lines, fmt.Sprintf("- nodes: %d (stored)", cluster.NodeCount))
+		section.err = err.Error()
+	}
+	return section
+}
+
+func (b *LLMContextBuilder) alertSection(cluster *model.K8sCluster) contextSection {
+	section := contextSection{name: model.LLMContextAlerts, title: "Firing alerts"}
+
+	var alerts []model.Alert
+	err := b.db.Where("cluster_id = ? AND user_id = ? AND status = ?", cluster.ID, cluster.UserID, model.AlertStatusFiring).
+		Order("CASE severity WHEN 'critical' THEN 0 WHEN 'warning' THEN 1 ELSE 2 END").
+		Order("started_at DESC").
+		Limit(llmContextAlertLimit).
+		Find(&alerts).Error
+	if err != nil {
+		section.err = err.Error()
+		return section
+	}
+	if len(alerts) == 0 {
+		section.lines = append(section.lines, "- none")
+		return section
+	}
+
+	for _, alert := range alerts {
+		line := fmt.Sprintf("- [%s] %s (value %.2f, threshold %.2f) since %s",
+			alert.Severity, alert.Title, alert.Value, alert.Threshold, alert.StartedAt.UTC().Format(time.RFC3339))
+		if alert.Description != "" {
+			line += ": " + truncateRunes(alert.Description, llmContextMessageChars)
+		}
+		section.lines = append(section.lines, line)
+	}
+	return section
+}
+
+func (b *LLMContextBuilder) eventSection(ctx context.Context, now time.Time, connect func() (*k8s.ClusterClient, error)) contextSection {
+	section := contextSection{name: model.LLMContextEvents, title: "Warning events (last hour)"}
+
+	client, err := connect()
+	if err != nil {
+		section.err = err.Error()
+		return section
+	}
+	events, err := client.GetWarningEvents(ctx, now.Add(-llmContextEventWindow), llmContextEventLimit)
+	if err != nil {
+		section.err = err.Error()
+		return section
+	}
+	if len(events) == 0 {
+		section.lines = append(section.lines, "- none")
+		return section
+	}
+
+	for _, e := range events {
+		object := e.Kind + " " + e.Name
+		if e.Namespace != "" {
+			object = e.Kind + " " + e.Namespace + "/" + e.Name
+		}
+		line := fmt.Sprintf("- %s %s %s", e.LastSeen.UTC().Format(time.RFC3339), e.Reason, object)
+		if e.Count > 1 {
+			line += fmt.Sprintf(" (x%d)", e.Count)
+		}
+		section.lines = append(section.lines, line+": "+truncateRunes(e.Message, llmContextMessageChars))
+	}
+	return section
+}
+
+func (b *LLMContextBuilder) metricSection(cluster *model.K8sCluster, now time.Time) contextSection {
+	section := contextSection{name: model.LLMContextMetrics, title: "Key metrics"}
+
+	var latest model.ClusterMetric
+	if err := b.db.Where("cluster_id = ?", cluster.ID).Order("timestamp DESC").First(&latest).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			section.lines = append(section.lines, "- no metrics collected")
+		} else {
+			section.err = err.Error()
+		}
+		return section
+	}
+
+	// The oldest sample within the last hour gives the trend
+	var earlier model.ClusterMetric
+	hasEarlier := b.db.Where("cluster_id = ? AND timestamp >= ? AND timestamp < ?", cluster.ID, now.Add(-time.Hour).Unix(), latest.Timestamp).
+		Order("timestamp").First(&earlier).Error == nil
+
+	cpu := fmt.Sprintf("- cpu usage: %.1f%%", latest.CPUUsagePercent)
+	if hasEarlier {
+		cpu += fmt.Sprintf(" (%.1f%% at %s)", earlier.CPUUsagePercent, time.Unix(earlier.Timestamp, 0).UTC().Format(time.RFC3339))
+	}
+	section.lines = append(section.lines,
+		fmt.Sprintf("- sampled at %s", time.Unix(latest.Timestamp, 0).UTC().Format(time.RFC3339)),
+		cpu,
+	)
+	if latest.MemoryTotalBytes > 0 {
+		section.lines = append(section.lines, fmt.Sprintf("- memory: %s of %s (%.1f%%)",
+			formatBytes(latest.MemoryUsageBytes), formatBytes(latest.MemoryTotalBytes),
+			float64(latest.MemoryUsageBytes)*100/float64(latest.MemoryTotalBytes)))
+	}
+	section.lines = append(section.lines,
+		fmt.Sprintf("- nodes ready: %d/%d", latest.ReadyNodeCount, latest.NodeCount),
+		fmt.Sprintf("- pods: %d total, %d running, %d pending, %d failed",
+			latest.PodCount, latest.RunningPodCount, latest.PendingPodCount, latest.FailedPodCount),
+	)
+	if latest.KubeStateAvailable {
+		section.lines = append(section.lines, fmt.Sprintf(
+			"- deployments unavailable: %d/%d, crash-looping pods: %d, failed jobs: %d",
+			latest.UnavailableDeploymentCount, latest.DeploymentCount, latest.CrashLoopPodCount, latest.FailedJobCount))
+	}
+	return section
+}
+
+// fitContext renders the sections within budget characters. When everything does not
+// fit, each section gets an equal share of the budget, with shares a small section
+// does not use passed on to the larger ones; sections then drop their trailing lines.
+func fitContext(preamble string, sections []contextSection, budget int) (string, []model.LLMContextSection, bool) {
+	const marker = "- ... %d more omitted"
+
+	remaining := budget - utf8.RuneCountInString(preamble)
+	sizes := make([]int, len(sections))
+	total := 0
+	for i, s := range sections {
+		sizes[i] = sectionSize(s, len(s.lines))
+		total += sizes[i]
+	}
+
+	allot := make([]int, len(sections))
+	if total <= remaining {
+		copy(allot, sizes)
+	} else {
+		order := make([]int, len(sections))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool { return sizes[order[a]] < sizes[order[b]] })
+		left := remaining
+		for n, i := range order {
+			share := left / (len(order) - n)
+			allot[i] = min(sizes[i], share)
+			left -= allot[i]
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(preamble)
+	summaries := make([]model.LLMContextSection, 0, len(sections))
+	truncated := false
+	for i, s := range sections {
+		count := len(s.lines)
+		if sectionSize(s, count) > allot[i] {
+			// Leave room for the omission marker
+			count--
+			for count > 0 && sectionSize(s, count)+utf8.RuneCountInString(fmt.Sprintf(marker, len(s.lines)-count))+1 > allot[i] {
+				count--
+			}
+		}
+
+		b.WriteString("\n\n### " + s.title)
+		if s.err != "" {
+			b.WriteString("\n(unavailable: " + truncateRunes(s.err, llmContextMessageChars) + ")")
+		}
+		for _, line := range s.lines[:count] {
+			b.WriteString("\n" + line)
+		}
+		if omitted := len(s.lines) - count; omitted > 0 {
+			b.WriteString("\n" + fmt.Sprintf(marker, omitted))
+			truncated = true
+		}
+
+		summaries = append(summaries, model.LLMContextSection{
+			Name:      s.name,
+			Items:     count,
+			Omitted:   len(s.lines) - count,
+			Size:      sectionSize(s, count),
+			Truncated: count < len(s.lines),
+			Error:     s.err,
+		})
+	}
+	return b.String(), summaries, truncated
+}
+
+// sectionSize is the rendered size of a section's title, error and first n lines
+func sectionSize(s contextSection, n int) int {
+	size := utf8.RuneCountInString(s.title) + 6
+	if s.err != "" {
+		size += utf8.RuneCountInString(truncateRunes(s.err, llmContextMessageChars)) + 16
+	}
+	for _, line := range s.lines[:n] {
+		size += utf8.RuneCountInString(line) + 1
+	}
+	return size
+}
+
+// BuildLLMPrompt assembles the messages for a reply: the system prompt, the cluster
+// context if any, then the conversation history in order
+func BuildLLMPrompt(conversation *model.LLMConversation, history []model.LLMMessage, snapshot *model.LLMContextSnapshot) []model.LLMChatMessage {
+	systemPrompt := conversation.SystemPrompt
+	if systemPrompt == "" {
+		systemPrompt = defaultLLMSystemPrompt
+	}
+	messages := []model.LLMChatMessage{{Role: "system", Content: systemPrompt}}
+	if snapshot != nil {
+		messages = append(messages, model.LLMChatMessage{Role: "system", Content: snapshot.Content})
+	}
+	for _, msg := range history {
+		messages = append(messages, model.LLMChatMessage{Role: msg.Role, Content: msg.Content})
+	}
+	return messages
+}
+
+func truncateRunes(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+func valueOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
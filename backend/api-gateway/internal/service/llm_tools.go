@@ -0,0 +1,420 @@
+// Package service provides read-only tools the LLM can call during a conversation
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// Tool calling limits
+const (
+	maxLLMToolRounds      = 5    // Model round trips before a final answer is forced
+	maxLLMToolResultChars = 8000 // Tool output returned to the model
+	llmToolTimeout        = 20 * time.Second
+	maxToolLogLines       = 200
+	maxToolSeries         = 20
+	maxToolRangePoints    = 120
+)
+
+// LLMToolCaller identifies who a tool runs for; tools are authorized as this user
+type LLMToolCaller struct {
+	UserID         uuid.UUID
+	Username       string
+	IPAddress      string
+	ConversationID uuid.UUID
+	ClusterID      *uuid.UUID
+}
+
+// llmTool is a whitelisted read-only operation
+type llmTool struct {
+	description string
+	parameters  string
+	// RBAC permission checked against the conversation's cluster
+	resource string
+	action   string
+	// needsCluster tools fail when the conversation has no cluster
+	needsCluster bool
+	run          func(ctx context.Context, e *LLMToolExecutor, caller *LLMToolCaller, args json.RawMessage) (interface{}, error)
+}
+
+// llmTools is the whitelist of tools offered to the LLM
+var llmTools = map[string]llmTool{
+	"list_pods": {
+		description:  "List pods in a namespace of the conversation's cluster with their phase, readiness and restart counts.",
+		parameters:   `{"type":"object","properties":{"namespace":{"type":"string","description":"Namespace; empty for all namespaces"}},"additionalProperties":false}`,
+		resource:     "pods",
+		action:       "list",
+		needsCluster: true,
+		run:          runListPods,
+	},
+	"get_pod_logs": {
+		description:  "Fetch the last lines of a pod's logs.",
+		parameters:   `{"type":"object","properties":{"namespace":{"type":"string"},"pod":{"type":"string"},"tailLines":{"type":"integer","minimum":1,"maximum":200}},"required":["namespace","pod"],"additionalProperties":false}`,
+		resource:     "pods",
+		action:       "logs",
+		needsCluster: true,
+		run:          runGetPodLogs,
+	},
+	"describe_deployment": {
+		description:  "Describe a deployment: replicas, strategy, containers with resources, conditions and recent events.",
+		parameters:   `{"type":"object","properties":{"namespace":{"type":"string"},"name":{"type":"string"}},"required":["namespace","name"],"additionalProperties":false}`,
+		resource:     "workloads",
+		action:       "get",
+		needsCluster: true,
+		run:          runDescribeDeployment,
+	},
+	"run_promql": {
+		description: "Run a PromQL query against the Prometheus data source for the cluster. Without range it is an instant query; with range (e.g. \"1h\") it returns a series over that lookback.",
+		parameters:  `{"type":"object","properties":{"query":{"type":"string"},"range":{"type":"string","description":"Lookback duration such as 30m or 6h"},"step":{"type":"string","description":"Resolution such as 1m"}},"required":["query"],"additionalProperties":false}`,
+		resource:    "prometheus",
+		action:      "query",
+		run:         runPromQL,
+	},
+}
+
+// LLMToolExecutor runs whitelisted tools for the LLM with the user's permissions
+// and records every invocation
+type LLMToolExecutor struct {
+	db *gorm.DB
+}
+
+// NewLLMToolExecutor creates a new tool executor
+func NewLLMToolExecutor(db *gorm.DB) *LLMToolExecutor {
+	return &LLMToolExecutor{db: db}
+}
+
+// Definitions returns the tool schemas offered to the LLM. Cluster tools are only
+// offered when the conversation has a cluster.
+func (e *LLMToolExecutor) Definitions(hasCluster bool) []model.LLMToolDefinition {
+	names := make([]string, 0, len(llmTools))
+	for name, tool := range llmTools {
+		if tool.needsCluster && !hasCluster {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defs := make([]model.LLMToolDefinition, 0, len(names))
+	for _, name := range names {
+		tool := llmTools[name]
+		defs = append(defs, model.LLMToolDefinition{
+			Type: "function",
+			Function: model.LLMToolFunctionSchema{
+				Name:        name,
+				Description: tool.description,
+				Parameters:  json.RawMessage(tool.parameters),
+			},
+		})
+	}
+	return defs
+}
+
+// Converse asks the LLM for a reply, running the tools it calls and feeding their
+// results back until it answers or maxLLMToolRounds is reached. Token usage is summed
+// across rounds.
+func (e *LLMToolExecutor) Converse(ctx context.Context, client *LLMClient, conversation *model.LLMConversation, messages []model.LLMChatMessage, caller *LLMToolCaller) (*LLMCompletion, []model.LLMToolInvocation, error) {
+	tools := e.Definitions(caller.ClusterID != nil)
+	var invocations []model.LLMToolInvocation
+	tokens, promptTokens, completionTokens := 0, 0, 0
+
+	for round := 0; ; round++ {
+		offered := tools
+		if round == maxLLMToolRounds {
+			// Withhold tools so the model has to answer with what it has
+			offered = nil
+		}
+		completion, err := client.Chat(ctx, conversation.Model, conversation.Temperature, conversation.MaxTokens, messages, offered)
+		if err != nil {
+			return nil, invocations, err
+		}
+		tokens += completion.TokensUsed
+		promptTokens += completion.PromptTokens
+		completionTokens += completion.CompletionTokens
+		if len(completion.ToolCalls) == 0 || offered == nil {
+			completion.TokensUsed = tokens
+			completion.PromptTokens, completion.CompletionTokens = promptTokens, completionTokens
+			completion.ToolCalls = nil
+			return completion, invocations, nil
+		}
+
+		messages = append(messages, model.LLMChatMessage{
+			Role:      "assistant",
+			Content:   completion.Content,
+			ToolCalls: completion.ToolCalls,
+		})
+		for _, call := range completion.ToolCalls {
+			invocation := e.Execute(ctx, caller, call)
+			invocations = append(invocations, *invocation)
+			content := invocation.Result
+			if invocation.Status != model.LLMToolSuccess {
+				content = toolErrorJSON(invocation.Error)
+			}
+			messages = append(messages, model.LLMChatMessage{
+				Role:       "tool",
+				ToolCallID: call.ID,
+				Content:    content,
+			})
+		}
+	}
+}
+
+// Execute runs one tool call after checking the caller's permission, then stores the
+// invocation and writes an audit log entry. Failures are reported in the invocation.
+func (e *LLMToolExecutor) Execute(ctx context.Context, caller *LLMToolCaller, call model.LLMToolCall) *model.LLMToolInvocation {
+	start := time.Now()
+	invocation := &model.LLMToolInvocation{
+		ConversationID: caller.ConversationID,
+		UserID:         caller.UserID,
+		ClusterID:      caller.ClusterID,
+		ToolCallID:     call.ID,
+		Tool:           call.Function.Name,
+		Arguments:      call.Function.Arguments,
+		Status:         model.LLMToolSuccess,
+	}
+
+	result, err := e.run(ctx, caller, call)
+	switch {
+	case errors.Is(err, errToolDenied):
+		invocation.Status = model.LLMToolDenied
+		invocation.Error = err.Error()
+	case err != nil:
+		invocation.Status = model.LLMToolFailed
+		invocation.Error = err.Error()
+	default:
+		invocation.Result = result
+	}
+	invocation.DurationMs = time.Since(start).Milliseconds()
+
+	e.db.Create(invocation)
+	e.audit(caller, invocation)
+	return invocation
+}
+
+// errToolDenied marks tool calls rejected by RBAC
+var errToolDenied = errors.New("permission denied")
+
+func (e *LLMToolExecutor) run(ctx context.Context, caller *LLMToolCaller, call model.LLMToolCall) (string, error) {
+	tool, ok := llmTools[call.Function.Name]
+	if !ok {
+		return "", fmt.Errorf("unknown tool: %s", call.Function.Name)
+	}
+	if tool.needsCluster && caller.ClusterID == nil {
+		return "", fmt.Errorf("the conversation is not linked to a cluster")
+	}
+
+	check := model.UserHasPermission(e.db, caller.UserID, tool.resource, tool.action, caller.ClusterID, "cluster")
+	if !check.Allowed {
+		return "", fmt.Errorf("%w: %s.%s required", errToolDenied, tool.resource, tool.action)
+	}
+
+	args := json.RawMessage(call.Function.Arguments)
+	if strings.TrimSpace(call.Function.Arguments) == "" {
+		args = json.RawMessage("{}")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, llmToolTimeout)
+	defer cancel()
+	output, err := tool.run(ctx, e, caller, args)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(output)
+	if err != nil {
+		return "", err
+	}
+	return truncateToolResult(string(data)), nil
+}
+
+// audit records the invocation in the audit log alongside HTTP requests
+func (e *LLMToolExecutor) audit(caller *LLMToolCaller, invocation *model.LLMToolInvocation) {
+	status := 200
+	switch invocation.Status {
+	case model.LLMToolDenied:
+		status = 403
+	case model.LLMToolFailed:
+		status = 500
+	}
+	resourceID := invocation.Tool
+	if caller.ClusterID != nil {
+		resourceID = caller.ClusterID.String()
+	}
+	e.db.Create(&model.AuditLog{
+		ID:         uuid.New(),
+		UserID:     caller.UserID,
+		Username:   caller.Username,
+		Action:     "llm_tool_call",
+		Resource:   "llm-tools",
+		ResourceID: resourceID,
+		Method:     "TOOL",
+		Path:       fmt.Sprintf("/api/v1/ai/llm/conversations/%s/tools/%s", caller.ConversationID, invocation.Tool),
+		IPAddress:  caller.IPAddress,
+		StatusCode: status,
+		ErrorMsg:   invocation.Error,
+		NewValue:   invocation.Arguments,
+	})
+}
+
+// clusterClient connects to the conversation's cluster, which the caller must own
+func (e *LLMToolExecutor) clusterClient(caller *LLMToolCaller) (*k8s.ClusterClient, error) {
+	var cluster model.K8sCluster
+	if err := e.db.Where("id = ? AND user_id = ?", *caller.ClusterID, caller.UserID).First(&cluster).Error; err != nil {
+		return nil, fmt.Errorf("cluster not found")
+	}
+	return k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+}
+
+func runListPods(ctx context.Context, e *LLMToolExecutor, caller *LLMToolCaller, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Namespace string `json:"namespace"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	client, err := e.clusterClient(caller)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := client.GetPods(ctx, args.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"total": len(pods), "pods": pods}, nil
+}
+
+func runGetPodLogs(ctx context.Context, e *LLMToolExecutor, caller *LLMToolCaller, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Namespace string `json:"namespace"`
+		Pod       string `json:"pod"`
+		TailLines int64  `json:"tailLines"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if args.Namespace == "" || args.Pod == "" {
+		return nil, fmt.Errorf("namespace and pod are required")
+	}
+	if args.TailLines <= 0 || args.TailLines > maxToolLogLines {
+		args.TailLines = 50
+	}
+	client, err := e.clusterClient(caller)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := client.GetPodLogs(ctx, args.Namespace, args.Pod, args.TailLines)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"namespace": args.Namespace, "pod": args.Pod, "logs": logs}, nil
+}
+
+func runDescribeDeployment(ctx context.Context, e *LLMToolExecutor, caller *LLMToolCaller, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if args.Namespace == "" || args.Name == "" {
+		return nil, fmt.Errorf("namespace and name are required")
+	}
+	client, err := e.clusterClient(caller)
+	if err != nil {
+		return nil, err
+	}
+	return client.DescribeDeployment(ctx, args.Namespace, args.Name)
+}
+
+func runPromQL(ctx context.Context, e *LLMToolExecutor, caller *LLMToolCaller, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Query string `json:"query"`
+		Range string `json:"range"`
+		Step  string `json:"step"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+
+	var ds model.PrometheusDataSource
+	query := e.db.Where("user_id = ? AND status = ?", caller.UserID, model.DSStatusActive)
+	if caller.ClusterID != nil {
+		query = query.Order(gorm.Expr("COALESCE(cluster_id = ?, false) DESC", *caller.ClusterID))
+	}
+	if err := query.Order("created_at").First(&ds).Error; err != nil {
+		return nil, fmt.Errorf("no active Prometheus data source")
+	}
+	client, err := NewDataSourceQuerier(e.db, &ds)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if args.Range == "" {
+		series, _, err := client.Query(ctx, args.Query, now)
+		if err != nil {
+			return nil, err
+		}
+		return promToolResult(args.Query, series), nil
+	}
+
+	lookback, err := time.ParseDuration(args.Range)
+	if err != nil || lookback <= 0 || lookback > maxCorrelationRange {
+		return nil, fmt.Errorf("range must be a duration up to %s", maxCorrelationRange)
+	}
+	step := lookback / maxToolRangePoints
+	if args.Step != "" {
+		if step, err = time.ParseDuration(args.Step); err != nil || step <= 0 {
+			return nil, fmt.Errorf("invalid step")
+		}
+	}
+	// Keep the result small enough to be useful to the model
+	step = max(step, lookback/maxToolRangePoints, time.Second)
+	series, _, err := client.QueryRange(ctx, args.Query, now.Add(-lookback), now, step)
+	if err != nil {
+		return nil, err
+	}
+	return promToolResult(args.Query, series), nil
+}
+
+// promToolResult caps the number of series returned to the model
+func promToolResult(query string, series []model.PrometheusSeries) map[string]interface{} {
+	result := map[string]interface{}{"query": query, "total": len(series)}
+	if len(series) > maxToolSeries {
+		series = series[:maxToolSeries]
+		result["truncated"] = true
+	}
+	result["series"] = series
+	return result
+}
+
+// truncateToolResult keeps tool output within maxLLMToolResultChars
+func truncateToolResult(s string) string {
+	if utf8.RuneCountInString(s) <= maxLLMToolResultChars {
+		return s
+	}
+	return string([]rune(s)[:maxLLMToolResultChars]) + fmt.Sprintf("... [truncated, %d characters total]", utf8.RuneCountInString(s))
+}
+
+func toolErrorJSON(message string) string {
+	data, _ := json.Marshal(map[string]string{"error": message})
+	return string(data)
+}
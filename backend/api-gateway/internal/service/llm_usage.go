@@ -0,0 +1,153 @@
+// Package service provides LLM cost tracking and usage reports
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// llmUsageCurrency is the currency of LLM prices and costs
+const llmUsageCurrency = "USD"
+
+// llmUsageTopConversations bounds the conversations listed in a usage report
+const llmUsageTopConversations = 50
+
+// LLMUsageService prices LLM replies and reports token usage and cost against the
+// monthly token budgets, which are the llm_tokens quotas
+type LLMUsageService struct {
+	db       *gorm.DB
+	settings *SettingsService
+	quotas   *QuotaService
+}
+
+// NewLLMUsageService creates a new LLM usage service
+func NewLLMUsageService(db *gorm.DB, settings *SettingsService, quotas *QuotaService) *LLMUsageService {
+	return &LLMUsageService{db: db, settings: settings, quotas: quotas}
+}
+
+// Price returns the price of a model from the llm.pricing setting. A model matches
+// its own entry first and otherwise the longest entry it starts with, so "gpt-4o"
+// also prices "gpt-4o-2024-08-06". Unpriced models cost nothing.
+func (s *LLMUsageService) Price(modelName string) (model.LLMModelPrice, bool) {
+	var pricing map[string]model.LLMModelPrice
+	if err := json.Unmarshal([]byte(s.settings.String(model.SettingLLMPricing)), &pricing); err != nil {
+		return model.LLMModelPrice{}, false
+	}
+	if price, ok := pricing[modelName]; ok {
+		return price, true
+	}
+	var match string
+	for prefix := range pricing {
+		if strings.HasPrefix(modelName, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	if match == "" {
+		return model.LLMModelPrice{}, false
+	}
+	return pricing[match], true
+}
+
+// Cost returns the cost of a reply. Providers that report only a total have it
+// charged at the output price.
+func (s *LLMUsageService) Cost(modelName string, promptTokens, completionTokens, totalTokens int) float64 {
+	price, ok := s.Price(modelName)
+	if !ok {
+		return 0
+	}
+	if promptTokens == 0 && completionTokens == 0 {
+		return float64(totalTokens) * price.Output / 1e6
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6
+}
+
+// Report returns the LLM usage of a user or org in the month containing month,
+// broken down by model and conversation, and by user for an org. The budget is
+// included for the current month, which is the period the quota counts.
+func (s *LLMUsageService) Report(scope, subject string, month time.Time) (*model.LLMUsageReport, error) {
+	var users *gorm.DB
+	switch scope {
+	case model.QuotaScopeUser:
+		users = s.db.Model(&model.User{}).Select("id").Where("id = ?", subject)
+	case model.QuotaScopeOrg:
+		users = s.db.Model(&model.User{}).Select("id").Where("department = ?", subject)
+	default:
+		return nil, fmt.Errorf("%w: scope must be user or org", ErrInvalidQuota)
+	}
+
+	start := llmTokenPeriodStart(month)
+	end := start.AddDate(0, 1, 0)
+	replies := func() *gorm.DB {
+		return s.db.Table("llm_messages").
+			Joins("JOIN llm_conversations ON llm_conversations.id = llm_messages.conversation_id").
+			Where("llm_messages.role = ? AND llm_conversations.user_id IN (?)", "assistant", users).
+			Where("llm_messages.created_at >= ? AND llm_messages.created_at < ?", start, end)
+	}
+	const totals = "COUNT(*) AS messages, COALESCE(SUM(llm_messages.tokens_used), 0) AS tokens, " +
+		"COALESCE(SUM(llm_messages.prompt_tokens), 0) AS prompt_tokens, " +
+		"COALESCE(SUM(llm_messages.completion_tokens), 0) AS completion_tokens, " +
+		"COALESCE(SUM(llm_messages.cost), 0) AS cost"
+
+	report := &model.LLMUsageReport{
+		Scope:          scope,
+		Subject:        subject,
+		PeriodStart:    start,
+		PeriodEnd:      end,
+		Currency:       llmUsageCurrency,
+		ByModel:        []model.LLMModelUsage{},
+		ByConversation: []model.LLMConversationUsage{},
+	}
+	if err := replies().Select(totals).Scan(&report.Totals).Error; err != nil {
+		return nil, err
+	}
+
+	// Replies written before models were recorded fall back to the conversation's
+	const replyModel = "COALESCE(NULLIF(llm_messages.model, ''), llm_conversations.model)"
+	if err := replies().Select(replyModel + " AS model, " + totals).
+		Group(replyModel).Order("tokens DESC").Scan(&report.ByModel).Error; err != nil {
+		return nil, err
+	}
+	if err := replies().Select("llm_conversations.id AS conversation_id, llm_conversations.title, llm_conversations.user_id, " + totals).
+		Group("llm_conversations.id, llm_conversations.title, llm_conversations.user_id").
+		Order("tokens DESC").Limit(llmUsageTopConversations).Scan(&report.ByConversation).Error; err != nil {
+		return nil, err
+	}
+	if scope == model.QuotaScopeOrg {
+		report.ByUser = []model.LLMUserUsage{}
+		if err := replies().Joins("JOIN users ON users.id = llm_conversations.user_id").
+			Select("users.id AS user_id, users.username, " + totals).
+			Group("users.id, users.username").Order("tokens DESC").Scan(&report.ByUser).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if start.Equal(llmTokenPeriodStart(time.Now())) {
+		limit, soft, err := s.quotas.Limit(scope, subject, model.QuotaResourceLLMTokens)
+		if err != nil {
+			return nil, err
+		}
+		if limit != nil {
+			usage, err := s.quotas.usage(model.QuotaResourceLLMTokens, users)
+			if err != nil {
+				return nil, err
+			}
+			var used int64
+			for _, n := range usage {
+				used += n
+			}
+			report.Budget = &model.LLMBudgetStatus{
+				Limit:     *limit,
+				Used:      used,
+				Remaining: max(*limit-used, 0),
+				Soft:      soft,
+				Exceeded:  used >= *limit,
+			}
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// Log query limits
+const (
+	DefaultLogQueryLimit = 200
+	MaxLogQueryLimit     = 5000
+)
+
+// logLevelPattern finds a severity keyword in an unstructured log line
+var logLevelPattern = regexp.MustCompile(`(?i)\b(fatal|panic|error|err|warn|warning|info|debug|trace)\b`)
+
+// LogBackend queries a log aggregation backend
+type LogBackend interface {
+	// Ping checks that the backend is reachable and answering queries
+	Ping(ctx context.Context) error
+	// Query returns up to limit entries matching query within the range, newest first
+	Query(ctx context.Context, query string, start, end time.Time, limit int) ([]model.LogEntry, error)
+}
+
+// NewLogBackend creates a client for the data source's backend type
+func NewLogBackend(ds *model.LogDataSource) (LogBackend, error) {
+	client, err := newTraceHTTPClient(ds.URL, ds.Headers, ds.TenantID, ds.Username, ds.Password, ds.Token, ds.InsecureSkipTLS)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ds.Type {
+	case model.LogBackendLoki:
+		return &lokiBackend{client}, nil
+	}
+	return nil, fmt.Errorf("unsupported log backend type: %s", ds.Type)
+}
+
+// lokiBackend queries the Loki HTTP API
+type lokiBackend struct {
+	client *traceHTTPClient
+}
+
+func (b *lokiBackend) Ping(ctx context.Context) error {
+	return b.client.get(ctx, "/loki/api/v1/labels", nil, nil)
+}
+
+type lokiQueryResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+func (b *lokiBackend) Query(ctx context.Context, query string, start, end time.Time, limit int) ([]model.LogEntry, error) {
+	params := url.Values{
+		"query":     {query},
+		"start":     {strconv.FormatInt(start.UnixNano(), 10)},
+		"end":       {strconv.FormatInt(end.UnixNano(), 10)},
+		"limit":     {strconv.Itoa(limit)},
+		"direction": {"backward"},
+	}
+
+	var resp lokiQueryResponse
+	if err := b.client.get(ctx, "/loki/api/v1/query_range", params, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data.ResultType != "streams" {
+		return nil, fmt.Errorf("query must return log streams, got %s", resp.Data.ResultType)
+	}
+
+	var entries []model.LogEntry
+	for _, stream := range resp.Data.Result {
+		for _, value := range stream.Values {
+			ns, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, model.LogEntry{
+				Timestamp: time.Unix(0, ns).UTC(),
+				Line:      value[1],
+				Level:     LogLevel(value[1], stream.Stream),
+				Labels:    stream.Stream,
+			})
+		}
+	}
+	// Streams are ordered individually; merge them into one newest-first list
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp.After(entries[j].Timestamp) })
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// LogLevel returns the normalized severity of a log line, preferring a level label
+// over a keyword found in the line itself
+func LogLevel(line string, labels map[string]string) string {
+	level := labels["level"]
+	if level == "" {
+		level = labels["detected_level"]
+	}
+	if level == "" {
+		level = logLevelPattern.FindString(line)
+	}
+
+	switch strings.ToLower(level) {
+	case "fatal", "panic", "critical", "crit":
+		return "fatal"
+	case "error", "err":
+		return "error"
+	case "warn", "warning":
+		return "warn"
+	case "info", "notice":
+		return "info"
+	case "debug", "trace":
+		return "debug"
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+// Package service provides business logic for log backends
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// defaultLogLookback is the range queried when no start time is given
+const defaultLogLookback = time.Hour
+
+// LogService queries log backends
+type LogService struct {
+	db *gorm.DB
+}
+
+// NewLogService creates a new log service
+func NewLogService(db *gorm.DB) *LogService {
+	return &LogService{db: db}
+}
+
+// Test checks that a data source is reachable and records the result
+func (s *LogService) Test(ctx context.Context, ds *model.LogDataSource) error {
+	backend, err := NewLogBackend(ds)
+	if err == nil {
+		err = backend.Ping(ctx)
+	}
+
+	updates := map[string]interface{}{
+		"last_test_at":     time.Now(),
+		"last_test_status": "success",
+		"last_test_error":  "",
+	}
+	if err != nil {
+		updates["last_test_status"] = "failed"
+		updates["last_test_error"] = err.Error()
+	}
+	s.db.Model(ds).Updates(updates)
+	return err
+}
+
+// Query runs a log query, defaulting to the last hour and DefaultLogQueryLimit entries
+func (s *LogService) Query(ctx context.Context, ds *model.LogDataSource, query string, start, end time.Time, limit int) ([]model.LogEntry, error) {
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if start.IsZero() {
+		start = end.Add(-defaultLogLookback)
+	}
+	if !start.Before(end) {
+		return nil, fmt.Errorf("start must be before end")
+	}
+	if limit <= 0 {
+		limit = DefaultLogQueryLimit
+	}
+	if limit > MaxLogQueryLimit {
+		limit = MaxLogQueryLimit
+	}
+
+	backend, err := NewLogBackend(ds)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := backend.Query(ctx, query, start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []model.LogEntry{}
+	}
+	return entries, nil
+}
@@ -0,0 +1,75 @@
+// Package service provides outgoing email over SMTP
+package service
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// ErrMailerNotConfigured is returned when sending email without an SMTP host
+var ErrMailerNotConfigured = errors.New("smtp is not configured")
+
+// Mailer sends plain text email through the SMTP server in the settings
+type Mailer struct {
+	settings *SettingsService
+}
+
+// NewMailer creates a new mailer
+func NewMailer(settings *SettingsService) *Mailer {
+	return &Mailer{settings: settings}
+}
+
+// Configured reports whether an SMTP server is set
+func (m *Mailer) Configured() bool {
+	return m != nil && m.settings.String(model.SettingSMTPHost) != ""
+}
+
+// Send sends a plain text email to a single recipient
+func (m *Mailer) Send(to, subject, body string) error {
+	return m.SendWithReplyTo(to, "", subject, body)
+}
+
+// SendWithReplyTo sends a plain text email to a single recipient, whose replies
+// go to replyTo rather than the From address when it is set
+func (m *Mailer) SendWithReplyTo(to, replyTo, subject, body string) error {
+	if !m.Configured() {
+		return ErrMailerNotConfigured
+	}
+	if strings.ContainsAny(to+replyTo+subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+
+	host := m.settings.String(model.SettingSMTPHost)
+	addr := net.JoinHostPort(host, strconv.Itoa(m.settings.Int(model.SettingSMTPPort)))
+	from := m.settings.String(model.SettingSMTPFrom)
+
+	var auth smtp.Auth
+	if username := m.settings.String(model.SettingSMTPUsername); username != "" {
+		auth = smtp.PlainAuth("", username, m.settings.String(model.SettingSMTPPassword), host)
+	}
+
+	headers := []string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	if replyTo != "" {
+		headers = append(headers, "Reply-To: "+replyTo)
+	}
+	msg := strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+	if err := smtp.SendMail(addr, auth, from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// Package service provides alert suppression during maintenance windows
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidMaintenanceWindow is returned for maintenance windows that cannot be created
+var ErrInvalidMaintenanceWindow = errors.New("invalid maintenance window")
+
+// Alert annotations set on alerts suppressed by a maintenance window
+const (
+	AnnotationMaintenanceWindowID   = "maintenance_window_id"
+	AnnotationMaintenanceWindowName = "maintenance_window"
+)
+
+// MaintenanceService manages maintenance windows and matches alerts against them
+type MaintenanceService struct {
+	db *gorm.DB
+}
+
+// NewMaintenanceService creates a new maintenance service
+func NewMaintenanceService(db *gorm.DB) *MaintenanceService {
+	return &MaintenanceService{db: db}
+}
+
+// Create validates and stores a maintenance window
+func (s *MaintenanceService) Create(userID uuid.UUID, createdBy string, req *model.CreateMaintenanceWindowRequest) (*model.MaintenanceWindow, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidMaintenanceWindow)
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		return nil, fmt.Errorf("%w: endsAt must be after startsAt", ErrInvalidMaintenanceWindow)
+	}
+	if !req.Recurrence.IsValid() {
+		return nil, fmt.Errorf("%w: recurrence must be daily or weekly", ErrInvalidMaintenanceWindow)
+	}
+	if period := req.Recurrence.Period(); period > 0 && req.EndsAt.Sub(req.StartsAt) > period {
+		return nil, fmt.Errorf("%w: a %s window cannot be longer than its period", ErrInvalidMaintenanceWindow, req.Recurrence)
+	}
+	if req.RecurrenceEnd != nil && req.RecurrenceEnd.Before(req.StartsAt) {
+		return nil, fmt.Errorf("%w: recurrenceEnd must be after startsAt", ErrInvalidMaintenanceWindow)
+	}
+	if err := validateAlertMatchers(req.Matchers); err != nil {
+		return nil, err
+	}
+
+	matchers, _ := json.Marshal(req.Matchers)
+	window := &model.MaintenanceWindow{
+		UserID:        userID,
+		Name:          req.Name,
+		Description:   req.Description,
+		Matchers:      string(matchers),
+		StartsAt:      req.StartsAt.UTC(),
+		EndsAt:        req.EndsAt.UTC(),
+		Recurrence:    req.Recurrence,
+		RecurrenceEnd: req.RecurrenceEnd,
+		CreatedBy:     createdBy,
+	}
+	if err := s.db.Create(window).Error; err != nil {
+		return nil, err
+	}
+	return window, nil
+}
+
+// Match returns the maintenance window of the alert's owner that covers the alert at t,
+// with the end of the current occurrence, or nil when none applies
+func (s *MaintenanceService) Match(alert *model.Alert, t time.Time) (*model.MaintenanceWindow, time.Time, error) {
+	var windows []model.MaintenanceWindow
+	err := s.db.Where("user_id = ? AND starts_at <= ? AND (expired_at IS NULL OR expired_at > ?)", alert.UserID, t, t).
+		Order("starts_at").Find(&windows).Error
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	for i := range windows {
+		_, end, ok := windows[i].OccurrenceAt(t)
+		if !ok {
+			continue
+		}
+		var matchers []model.AlertMatcher
+		if err := json.Unmarshal([]byte(windows[i].Matchers), &matchers); err != nil {
+			continue
+		}
+		if alertMatches(alert, matchers) {
+			return &windows[i], end, nil
+		}
+	}
+	return nil, time.Time{}, nil
+}
+
+// suppressAlert silences the alert until the end of the window occurrence and annotates
+// it with the window that applied
+func suppressAlert(alert *model.Alert, window *model.MaintenanceWindow, until time.Time) {
+	annotations := map[string]string{}
+	if alert.Annotations != "" {
+		json.Unmarshal([]byte(alert.Annotations), &annotations)
+	}
+	annotations[AnnotationMaintenanceWindowID] = window.ID.String()
+	annotations[AnnotationMaintenanceWindowName] = window.Name
+	data, _ := json.Marshal(annotations)
+
+	alert.Status = model.AlertStatusSilenced
+	alert.SilencedUntil = &until
+	alert.Annotations = string(data)
+}
+
+// List returns the user's maintenance windows, optionally only those with the given status
+func (s *MaintenanceService) List(userID uuid.UUID, status string) ([]model.MaintenanceWindowResponse, error) {
+	var windows []model.MaintenanceWindow
+	if err := s.db.Where("user_id = ?", userID).Order("starts_at DESC").Find(&windows).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	out := make([]model.MaintenanceWindowResponse, 0, len(windows))
+	for i := range windows {
+		resp := windows[i].Response(now)
+		if status == "" || resp.Status == status {
+			out = append(out, resp)
+		}
+	}
+	return out, nil
+}
+
+// Expire ends a maintenance window now. Alerts it suppressed fire again at their next
+// evaluation if their condition still holds.
+func (s *MaintenanceService) Expire(userID, windowID uuid.UUID) (*model.MaintenanceWindow, error) {
+	var window model.MaintenanceWindow
+	if err := s.db.Where("id = ? AND user_id = ?", windowID, userID).First(&window).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if window.ExpiredAt != nil && window.ExpiredAt.Before(now) {
+		return &window, nil
+	}
+	window.ExpiredAt = &now
+	if err := s.db.Save(&window).Error; err != nil {
+		return nil, err
+	}
+
+	// Lift the silence of alerts this window is still holding
+	s.db.Model(&model.Alert{}).
+		Where("user_id = ? AND status = ? AND silenced_until > ? AND annotations LIKE ?",
+			userID, model.AlertStatusSilenced, now, "%"+window.ID.String()+"%").
+		Update("silenced_until", now)
+	return &window, nil
+}
+
+func validateAlertMatchers(matchers []model.AlertMatcher) error {
+	// A window without matchers would silence every alert of the user
+	if len(matchers) == 0 {
+		return fmt.Errorf("%w: at least one matcher is required", ErrInvalidMaintenanceWindow)
+	}
+	for _, m := range matchers {
+		if m.Field == "" {
+			return fmt.Errorf("%w: matcher field is required", ErrInvalidMaintenanceWindow)
+		}
+		switch m.Operator {
+		case "=", "!=":
+		case "=~", "!~":
+			if _, err := regexp.Compile("^(?:" + m.Value + ")$"); err != nil {
+				return fmt.Errorf("%w: invalid regular expression for %s: %v", ErrInvalidMaintenanceWindow, m.Field, err)
+			}
+		default:
+			return fmt.Errorf("%w: matcher operator must be =, !=, =~ or !~", ErrInvalidMaintenanceWindow)
+		}
+	}
+	return nil
+}
+
+// alertMatches reports whether the alert satisfies every matcher
+func alertMatches(alert *model.Alert, matchers []model.AlertMatcher) bool {
+	var labels map[string]string
+	if alert.Labels != "" {
+		json.Unmarshal([]byte(alert.Labels), &labels)
+	}
+
+	for _, m := range matchers {
+		var value string
+		switch m.Field {
+		case "severity":
+			value = string(alert.Severity)
+		case "title":
+			value = alert.Title
+		case "ruleId":
+			value = alert.RuleID.String()
+		case "clusterId":
+			if alert.ClusterID != nil {
+				value = alert.ClusterID.String()
+			}
+		case "hostId":
+			if alert.HostID != nil {
+				value = alert.HostID.String()
+			}
+		default:
+			value = labels[m.Field]
+		}
+
+		var matched bool
+		switch m.Operator {
+		case "=":
+			matched = value == m.Value
+		case "!=":
+			matched = value != m.Value
+		case "=~", "!~":
+			// Anchored like Prometheus label matchers
+			re, err := regexp.Compile("^(?:" + m.Value + ")$")
+			if err != nil {
+				return false
+			}
+			matched = re.MatchString(value) == (m.Operator == "=~")
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+// Package service provides namespace bindings that grant users roles in a single
+// namespace of a Kubernetes cluster
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidNamespaceBinding is returned for bindings that cannot be granted
+var ErrInvalidNamespaceBinding = errors.New("invalid namespace binding")
+
+// namespacePattern matches Kubernetes namespace names (DNS labels)
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// NamespaceBindingService manages namespace bindings. A binding is a UserRole bound
+// to a cluster with the namespace set, so the role only applies in that namespace.
+type NamespaceBindingService struct {
+	db *gorm.DB
+}
+
+// NewNamespaceBindingService creates a new namespace binding service
+func NewNamespaceBindingService(db *gorm.DB) *NamespaceBindingService {
+	return &NamespaceBindingService{db: db}
+}
+
+// List returns the namespace bindings, optionally only those of a user or cluster
+func (s *NamespaceBindingService) List(userID, clusterID *uuid.UUID) ([]model.NamespaceBinding, error) {
+	query := s.db.Preload("Role").Where("resource_type = ? AND namespace <> ''", "cluster")
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	if clusterID != nil {
+		query = query.Where("resource_id = ?", *clusterID)
+	}
+
+	var userRoles []model.UserRole
+	if err := query.Order("created_at DESC").Find(&userRoles).Error; err != nil {
+		return nil, err
+	}
+	bindings := make([]model.NamespaceBinding, 0, len(userRoles))
+	for i := range userRoles {
+		bindings = append(bindings, toNamespaceBinding(&userRoles[i]))
+	}
+	return bindings, nil
+}
+
+// Grant gives a user a role in a cluster namespace. Granting an existing binding
+// again updates its expiry.
+func (s *NamespaceBindingService) Grant(req *model.CreateNamespaceBindingRequest, assignedBy uuid.UUID) (*model.NamespaceBinding, error) {
+	if req.UserID == uuid.Nil || req.ClusterID == uuid.Nil || req.RoleID == uuid.Nil {
+		return nil, fmt.Errorf("%w: userId, clusterId and roleId are required", ErrInvalidNamespaceBinding)
+	}
+	if !namespacePattern.MatchString(req.Namespace) {
+		return nil, fmt.Errorf("%w: namespace must be a valid Kubernetes namespace name", ErrInvalidNamespaceBinding)
+	}
+
+	if err := s.db.Select("id").First(&model.User{}, "id = ?", req.UserID).Error; err != nil {
+		return nil, bindingLookupError(err, "user")
+	}
+	if err := s.db.Select("id").First(&model.K8sCluster{}, "id = ?", req.ClusterID).Error; err != nil {
+		return nil, bindingLookupError(err, "cluster")
+	}
+	var role model.Role
+	if err := s.db.First(&role, "id = ?", req.RoleID).Error; err != nil {
+		return nil, bindingLookupError(err, "role")
+	}
+
+	var userRole model.UserRole
+	err := s.db.Where("user_id = ? AND role_id = ? AND resource_type = ? AND resource_id = ? AND namespace = ?",
+		req.UserID, req.RoleID, "cluster", req.ClusterID, req.Namespace).First(&userRole).Error
+	switch {
+	case err == nil:
+		if err := s.db.Model(&userRole).Update("expires_at", req.ExpiresAt).Error; err != nil {
+			return nil, err
+		}
+		userRole.ExpiresAt = req.ExpiresAt
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		clusterID := req.ClusterID
+		userRole = model.UserRole{
+			UserID:       req.UserID,
+			RoleID:       req.RoleID,
+			AssignedBy:   &assignedBy,
+			ResourceID:   &clusterID,
+			ResourceType: "cluster",
+			Namespace:    req.Namespace,
+			ExpiresAt:    req.ExpiresAt,
+		}
+		if err := s.db.Create(&userRole).Error; err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	userRole.Role = &role
+	binding := toNamespaceBinding(&userRole)
+	return &binding, nil
+}
+
+// Revoke removes a namespace binding
+func (s *NamespaceBindingService) Revoke(id uuid.UUID) error {
+	result := s.db.Where("id = ? AND resource_type = ? AND namespace <> ''", id, "cluster").Delete(&model.UserRole{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func bindingLookupError(err error, what string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %s not found", ErrInvalidNamespaceBinding, what)
+	}
+	return err
+}
+
+func toNamespaceBinding(userRole *model.UserRole) model.NamespaceBinding {
+	binding := model.NamespaceBinding{
+		ID:        userRole.ID,
+		UserID:    userRole.UserID,
+		Namespace: userRole.Namespace,
+		RoleID:    userRole.RoleID,
+		ExpiresAt: userRole.ExpiresAt,
+		CreatedAt: userRole.CreatedAt,
+	}
+	if userRole.ResourceID != nil {
+		binding.ClusterID = *userRole.ResourceID
+	}
+	if userRole.Role != nil {
+		binding.RoleName = userRole.Role.Name
+	}
+	return binding
+}
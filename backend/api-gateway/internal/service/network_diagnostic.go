@@ -0,0 +1,494 @@
+// Package service provides network diagnostics run by host agents
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// diagnosticAgentGrace is how long past a test's own time limit the agent may
+	// take to answer
+	diagnosticAgentGrace = 15 * time.Second
+	// diagnosticBandwidthPort is where bandwidth tests connect by default, as iperf3 does
+	diagnosticBandwidthPort = 5201
+	// diagnosticPruneInterval is how often expired diagnostics are deleted
+	diagnosticPruneInterval = time.Hour
+)
+
+var (
+	// ErrNetworkDiagnosticNotFound is returned when a diagnostic does not exist
+	ErrNetworkDiagnosticNotFound = errors.New("network diagnostic not found")
+	// ErrInvalidNetworkDiagnostic is returned when a diagnostic request is invalid
+	ErrInvalidNetworkDiagnostic = errors.New("invalid network diagnostic")
+	// ErrDiagnosticHostNotFound is returned when a diagnostic names a host that does not exist
+	ErrDiagnosticHostNotFound = errors.New("host not found")
+	// ErrDiagnosticHostUnavailable is returned when a host cannot run diagnostics,
+	// because it is not approved or its agent is offline
+	ErrDiagnosticHostUnavailable = errors.New("host agent is not available")
+)
+
+// diagnosticTargetPattern matches host names, addresses and DNS names. A leading
+// dash is refused so a target is never taken as an option of dig, traceroute or mtr.
+var diagnosticTargetPattern = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._:\-]{0,252}$`)
+
+// dnsRecordTypes are the record types dns diagnostics look up
+var dnsRecordTypes = map[string]bool{
+	"A": true, "AAAA": true, "CNAME": true, "MX": true, "NS": true, "TXT": true, "PTR": true,
+}
+
+// NetworkDiagnosticService runs DNS lookups, traceroutes, TCP connect tests and
+// bandwidth tests from host agents as operations and keeps their results
+type NetworkDiagnosticService struct {
+	db         *gorm.DB
+	logger     *zap.Logger
+	commands   *AgentCommandService
+	operations *OperationService
+	settings   *SettingsService
+}
+
+// NewNetworkDiagnosticService creates a new network diagnostic service
+func NewNetworkDiagnosticService(db *gorm.DB, logger *zap.Logger, commands *AgentCommandService, operations *OperationService, settings *SettingsService) *NetworkDiagnosticService {
+	return &NetworkDiagnosticService{db: db, logger: logger, commands: commands, operations: operations, settings: settings}
+}
+
+// Start records a diagnostic and runs it from the host's agent as an operation,
+// which is returned to be polled. The operation's result is the diagnostic.
+func (s *NetworkDiagnosticService) Start(userID uuid.UUID, req *model.RunNetworkDiagnosticRequest) (*model.Operation, error) {
+	spec, err := diagnosticSpec(req)
+	if err != nil {
+		return nil, err
+	}
+	host, err := s.agentHost(req.HostID)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostic := &model.NetworkDiagnostic{
+		ID:        uuid.New(),
+		UserID:    userID,
+		HostID:    host.ID,
+		HostName:  host.Hostname,
+		Type:      spec.Type,
+		Target:    spec.Target,
+		Status:    model.NetworkDiagnosticRunning,
+		StartedAt: time.Now(),
+	}
+	var peer *model.Host
+	if spec.Type == model.NetworkDiagnosticBandwidth {
+		if req.PeerHostID == nil {
+			return nil, fmt.Errorf("%w: a bandwidth test needs a peer host", ErrInvalidNetworkDiagnostic)
+		}
+		if *req.PeerHostID == host.ID {
+			return nil, fmt.Errorf("%w: the peer host must be another host", ErrInvalidNetworkDiagnostic)
+		}
+		if peer, err = s.agentHost(*req.PeerHostID); err != nil {
+			return nil, err
+		}
+		spec.Target = peer.IPAddress
+		diagnostic.Target = net.JoinHostPort(peer.IPAddress, strconv.Itoa(spec.Port))
+		diagnostic.PeerHostID = &peer.ID
+		diagnostic.PeerHostName = peer.Hostname
+	}
+	if diagnostic.Options, err = json.Marshal(spec); err != nil {
+		return nil, fmt.Errorf("failed to encode diagnostic options: %w", err)
+	}
+	if err := s.db.Create(diagnostic).Error; err != nil {
+		return nil, fmt.Errorf("failed to create diagnostic: %w", err)
+	}
+
+	operation, err := s.operations.Start(userID, OperationSpec{
+		Type:         model.OperationNetworkDiagnostic,
+		ResourceType: "network_diagnostic",
+		ResourceID:   &diagnostic.ID,
+		Message:      fmt.Sprintf("Running %s to %s from %s", spec.Type, diagnostic.Target, host.Hostname),
+		Cancellable:  true,
+		// A bandwidth test dispatches twice
+		Timeout: diagnosticTimeout(spec) + 2*diagnosticAgentGrace,
+	}, func(ctx context.Context) (interface{}, error) {
+		return s.run(ctx, userID, diagnostic, spec, host, peer)
+	})
+	if err != nil {
+		s.finish(diagnostic, nil, "", err)
+		return nil, err
+	}
+	s.db.Model(&model.NetworkDiagnostic{}).Where("id = ?", diagnostic.ID).Update("operation_id", operation.ID)
+	return operation, nil
+}
+
+// agentHost returns a host whose agent can run diagnostics
+func (s *NetworkDiagnosticService) agentHost(id uuid.UUID) (*model.Host, error) {
+	var host model.Host
+	if err := s.db.First(&host, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDiagnosticHostNotFound
+		}
+		return nil, err
+	}
+	if host.Status != model.HostStatusApproved && host.Status != model.HostStatusOnline && host.Status != model.HostStatusDegraded {
+		return nil, fmt.Errorf("%w: %s is %s", ErrDiagnosticHostUnavailable, host.Hostname, host.Status)
+	}
+	if !AgentAvailable(&host) {
+		return nil, fmt.Errorf("%w: the agent on %s is offline", ErrDiagnosticHostUnavailable, host.Hostname)
+	}
+	return &host, nil
+}
+
+// diagnosticSpec validates a request and fills in the defaults of its type
+func diagnosticSpec(req *model.RunNetworkDiagnosticRequest) (*model.NetworkDiagnosticSpec, error) {
+	spec := &model.NetworkDiagnosticSpec{Type: req.Type, Target: strings.TrimSpace(req.Target)}
+	if spec.Type != model.NetworkDiagnosticBandwidth && !diagnosticTargetPattern.MatchString(spec.Target) {
+		return nil, fmt.Errorf("%w: target must be a host name or address", ErrInvalidNetworkDiagnostic)
+	}
+
+	switch req.Type {
+	case model.NetworkDiagnosticDNS:
+		spec.RecordType = strings.ToUpper(req.RecordType)
+		if spec.RecordType == "" {
+			spec.RecordType = "A"
+		}
+		if !dnsRecordTypes[spec.RecordType] {
+			return nil, fmt.Errorf("%w: unsupported record type %s", ErrInvalidNetworkDiagnostic, req.RecordType)
+		}
+		if spec.RecordType == "PTR" && net.ParseIP(spec.Target) == nil {
+			return nil, fmt.Errorf("%w: PTR lookups need an address", ErrInvalidNetworkDiagnostic)
+		}
+		spec.Server = strings.TrimSpace(req.Server)
+		if spec.Server != "" && !diagnosticTargetPattern.MatchString(spec.Server) {
+			return nil, fmt.Errorf("%w: server must be a host name or address", ErrInvalidNetworkDiagnostic)
+		}
+		spec.Trace = req.Trace
+	case model.NetworkDiagnosticTraceroute, model.NetworkDiagnosticMTR:
+		spec.MaxHops = req.MaxHops
+		if spec.MaxHops == 0 {
+			spec.MaxHops = 30
+		}
+		if spec.MaxHops < 1 || spec.MaxHops > 64 {
+			return nil, fmt.Errorf("%w: max hops must be between 1 and 64", ErrInvalidNetworkDiagnostic)
+		}
+		if req.Type == model.NetworkDiagnosticMTR {
+			var ok bool
+			if spec.Count, ok = diagnosticCount(req.Count, 10, 100); !ok {
+				return nil, fmt.Errorf("%w: count must be between 1 and 100", ErrInvalidNetworkDiagnostic)
+			}
+		}
+	case model.NetworkDiagnosticTCP:
+		if req.Port < 1 || req.Port > 65535 {
+			return nil, fmt.Errorf("%w: port must be between 1 and 65535", ErrInvalidNetworkDiagnostic)
+		}
+		spec.Port = req.Port
+		var ok bool
+		if spec.Count, ok = diagnosticCount(req.Count, 3, 20); !ok {
+			return nil, fmt.Errorf("%w: count must be between 1 and 20", ErrInvalidNetworkDiagnostic)
+		}
+	case model.NetworkDiagnosticBandwidth:
+		spec.Port = req.Port
+		if spec.Port == 0 {
+			spec.Port = diagnosticBandwidthPort
+		}
+		if spec.Port < 1 || spec.Port > 65535 {
+			return nil, fmt.Errorf("%w: port must be between 1 and 65535", ErrInvalidNetworkDiagnostic)
+		}
+		spec.Duration = req.Duration
+		if spec.Duration == 0 {
+			spec.Duration = 10
+		}
+		if spec.Duration < 1 || spec.Duration > 60 {
+			return nil, fmt.Errorf("%w: duration must be between 1 and 60 seconds", ErrInvalidNetworkDiagnostic)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown type %s", ErrInvalidNetworkDiagnostic, req.Type)
+	}
+	return spec, nil
+}
+
+// diagnosticCount returns the count, or def when it is 0, and whether it is at most max
+func diagnosticCount(count, def, max int) (int, bool) {
+	if count == 0 {
+		return def, true
+	}
+	return count, count >= 1 && count <= max
+}
+
+// diagnosticTimeout is how long the agent may take to run a test
+func diagnosticTimeout(spec *model.NetworkDiagnosticSpec) time.Duration {
+	switch spec.Type {
+	case model.NetworkDiagnosticDNS:
+		if spec.Trace {
+			return 30 * time.Second
+		}
+		return 10 * time.Second
+	case model.NetworkDiagnosticTraceroute:
+		// traceroute waits up to 2s for each hop's single probe
+		return time.Duration(spec.MaxHops)*2*time.Second + 10*time.Second
+	case model.NetworkDiagnosticMTR:
+		// mtr sends a cycle a second and waits for the last replies
+		return time.Duration(spec.Count)*time.Second + 30*time.Second
+	case model.NetworkDiagnosticTCP:
+		return time.Duration(spec.Count) * 5 * time.Second
+	case model.NetworkDiagnosticBandwidth:
+		return time.Duration(spec.Duration)*time.Second + 10*time.Second
+	}
+	return 30 * time.Second
+}
+
+// run runs a diagnostic and records its result
+func (s *NetworkDiagnosticService) run(ctx context.Context, userID uuid.UUID, diagnostic *model.NetworkDiagnostic, spec *model.NetworkDiagnosticSpec, host, peer *model.Host) (*model.NetworkDiagnostic, error) {
+	var result interface{}
+	var err error
+	switch spec.Type {
+	case model.NetworkDiagnosticDNS:
+		var lookup model.DNSLookupResult
+		err = s.dispatch(ctx, host.ID, userID, model.AgentCommandNetworkDiagnostic, spec, diagnosticTimeout(spec), &lookup)
+		result = &lookup
+	case model.NetworkDiagnosticTraceroute, model.NetworkDiagnosticMTR:
+		var trace model.TraceResult
+		err = s.dispatch(ctx, host.ID, userID, model.AgentCommandNetworkDiagnostic, spec, diagnosticTimeout(spec), &trace)
+		result = &trace
+	case model.NetworkDiagnosticTCP:
+		var connect model.TCPConnectResult
+		err = s.dispatch(ctx, host.ID, userID, model.AgentCommandNetworkDiagnostic, spec, diagnosticTimeout(spec), &connect)
+		result = &connect
+	case model.NetworkDiagnosticBandwidth:
+		var bandwidth model.BandwidthResult
+		err = s.runBandwidth(ctx, userID, spec, host, peer, &bandwidth)
+		result = &bandwidth
+	}
+
+	if err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			err = errors.New("cancelled")
+		}
+		s.finish(diagnostic, nil, "", err)
+		return nil, err
+	}
+	s.finish(diagnostic, result, diagnosticSummary(spec, result), nil)
+	return s.Get(diagnostic.ID)
+}
+
+// runBandwidth has the peer's agent listen for the test and the host's agent
+// send to it. The token keeps anything else that connects from being counted.
+func (s *NetworkDiagnosticService) runBandwidth(ctx context.Context, userID uuid.UUID, spec *model.NetworkDiagnosticSpec, host, peer *model.Host, result *model.BandwidthResult) error {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return fmt.Errorf("failed to generate token: %w", err)
+	}
+	server := model.BandwidthServerSpec{Port: spec.Port, Token: hex.EncodeToString(token), Duration: spec.Duration}
+	var info model.BandwidthServerInfo
+	if err := s.dispatch(ctx, peer.ID, userID, model.AgentCommandBandwidthServer, server, 0, &info); err != nil {
+		return fmt.Errorf("failed to start the test server on %s: %w", peer.Hostname, err)
+	}
+
+	client := *spec
+	client.Port = info.Port
+	client.Token = server.Token
+	return s.dispatch(ctx, host.ID, userID, model.AgentCommandNetworkDiagnostic, &client, diagnosticTimeout(spec), result)
+}
+
+// dispatch runs a command on a host's agent and decodes its output into out
+func (s *NetworkDiagnosticService) dispatch(ctx context.Context, hostID, userID uuid.UUID, cmdType model.AgentCommandType, args interface{}, timeout time.Duration, out interface{}) error {
+	cmd, err := s.commands.Dispatch(ctx, hostID, &userID, cmdType, args, timeout+diagnosticAgentGrace)
+	if err != nil {
+		return err
+	}
+	if cmd.Status != model.AgentCommandStatusCompleted {
+		if cmd.ErrorMessage != "" {
+			return fmt.Errorf("%s", cmd.ErrorMessage)
+		}
+		return fmt.Errorf("command %s", cmd.Status)
+	}
+	if err := json.Unmarshal([]byte(cmd.Output), out); err != nil {
+		return fmt.Errorf("invalid agent output: %w", err)
+	}
+	return nil
+}
+
+// finish records how a diagnostic ended
+func (s *NetworkDiagnosticService) finish(diagnostic *model.NetworkDiagnostic, result interface{}, summary string, runErr error) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"completed_at": now,
+		"duration":     now.Sub(diagnostic.StartedAt).Milliseconds(),
+	}
+	if runErr != nil {
+		updates["status"] = model.NetworkDiagnosticFailed
+		updates["error"] = runErr.Error()
+	} else {
+		updates["status"] = model.NetworkDiagnosticCompleted
+		updates["summary"] = summary
+		if data, err := json.Marshal(result); err == nil {
+			updates["result"] = data
+		}
+	}
+	if err := s.db.Model(&model.NetworkDiagnostic{}).Where("id = ?", diagnostic.ID).Updates(updates).Error; err != nil {
+		s.logger.Error("failed to record network diagnostic", zap.String("diagnosticId", diagnostic.ID.String()), zap.Error(err))
+	}
+}
+
+// diagnosticSummary describes a result in a line for the history
+func diagnosticSummary(spec *model.NetworkDiagnosticSpec, result interface{}) string {
+	var summary string
+	switch r := result.(type) {
+	case *model.DNSLookupResult:
+		if r.Error != "" {
+			summary = "Did not resolve: " + r.Error
+		} else {
+			summary = fmt.Sprintf("%d %s record(s) in %.1f ms", len(r.Records), r.RecordType, r.Latency)
+		}
+	case *model.TraceResult:
+		summary = fmt.Sprintf("%d hops, destination not reached", len(r.Hops))
+		if r.Reached {
+			summary = fmt.Sprintf("%d hops, destination reached", len(r.Hops))
+		}
+		if spec.Type == model.NetworkDiagnosticMTR && len(r.Hops) > 0 {
+			last := r.Hops[len(r.Hops)-1]
+			summary += fmt.Sprintf(", %.1f%% loss, %.1f ms avg", last.Loss, last.Avg)
+		}
+	case *model.TCPConnectResult:
+		summary = fmt.Sprintf("%d/%d connected", r.Succeeded, len(r.Attempts))
+		var total float64
+		for _, a := range r.Attempts {
+			if a.Error == "" {
+				total += a.Latency
+			}
+		}
+		if r.Succeeded > 0 {
+			summary += fmt.Sprintf(", %.1f ms avg", total/float64(r.Succeeded))
+		} else if len(r.Attempts) > 0 {
+			summary += ": " + r.Attempts[len(r.Attempts)-1].Error
+		}
+	case *model.BandwidthResult:
+		summary = fmt.Sprintf("%.1f Mbit/s over %.1fs", r.BitsPerSecond/1e6, r.Seconds)
+	}
+	if len(summary) > 255 {
+		summary = summary[:252] + "..."
+	}
+	return summary
+}
+
+// ============== History ==============
+
+// List returns a page of diagnostics, newest first, and their total
+func (s *NetworkDiagnosticService) List(filter *model.NetworkDiagnosticFilter) ([]model.NetworkDiagnostic, int64, error) {
+	query := s.db.Model(&model.NetworkDiagnostic{})
+	if filter.HostID != nil {
+		query = query.Where("host_id = ? OR peer_host_id = ?", *filter.HostID, *filter.HostID)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Search != "" {
+		query = query.Where("target ILIKE ?", sanitize.Contains(filter.Search))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count diagnostics: %w", err)
+	}
+
+	// The history leaves out the results, which can be long
+	diagnostics := []model.NetworkDiagnostic{}
+	err := query.Omit("result").Order("created_at DESC").
+		Offset((filter.Page - 1) * filter.PageSize).Limit(filter.PageSize).
+		Find(&diagnostics).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list diagnostics: %w", err)
+	}
+	return diagnostics, total, nil
+}
+
+// Get returns a diagnostic with its result
+func (s *NetworkDiagnosticService) Get(id uuid.UUID) (*model.NetworkDiagnostic, error) {
+	var diagnostic model.NetworkDiagnostic
+	if err := s.db.First(&diagnostic, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNetworkDiagnosticNotFound
+		}
+		return nil, err
+	}
+	return &diagnostic, nil
+}
+
+// Delete deletes a diagnostic from the history
+func (s *NetworkDiagnosticService) Delete(id uuid.UUID) error {
+	result := s.db.Where("id = ? AND status <> ?", id, model.NetworkDiagnosticRunning).Delete(&model.NetworkDiagnostic{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.Get(id); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: the diagnostic is still running", ErrInvalidNetworkDiagnostic)
+	}
+	return nil
+}
+
+// Run fails diagnostics whose operation was interrupted and prunes expired
+// ones every hour until ctx is done
+func (s *NetworkDiagnosticService) Run(ctx context.Context) {
+	ticker := time.NewTicker(diagnosticPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if failed, err := s.FailInterrupted(); err != nil {
+			s.logger.Error("failed to fail interrupted network diagnostics", zap.Error(err))
+		} else if failed > 0 {
+			s.logger.Warn("failed interrupted network diagnostics", zap.Int64("failed", failed))
+		}
+		if deleted, err := s.Prune(); err != nil {
+			s.logger.Error("failed to prune network diagnostics", zap.Error(err))
+		} else if deleted > 0 {
+			s.logger.Info("pruned network diagnostics", zap.Int64("deleted", deleted))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// FailInterrupted fails the running diagnostics whose operation has ended
+// without them, as when the gateway running them stopped
+func (s *NetworkDiagnosticService) FailInterrupted() (int64, error) {
+	done := s.db.Model(&model.Operation{}).Select("id").
+		Where("status IN ?", []model.OperationStatus{model.OperationFailed, model.OperationCancelled})
+	result := s.db.Model(&model.NetworkDiagnostic{}).
+		Where("status = ? AND operation_id IN (?)", model.NetworkDiagnosticRunning, done).
+		Updates(map[string]interface{}{
+			"status":       model.NetworkDiagnosticFailed,
+			"error":        "interrupted",
+			"completed_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// Prune deletes diagnostics older than the retention setting and returns the number deleted
+func (s *NetworkDiagnosticService) Prune() (int64, error) {
+	retention := s.settings.Duration(model.SettingDiagnosticRetention)
+	if retention <= 0 {
+		return 0, nil
+	}
+	result := s.db.Where("created_at < ? AND status <> ?", time.Now().Add(-retention), model.NetworkDiagnosticRunning).
+		Delete(&model.NetworkDiagnostic{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,177 @@
+// Package service provides node maintenance of managed clusters: cordoning,
+// uncordoning and draining nodes
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultDrainTimeout is how long a drain waits for the node to empty unless asked otherwise
+	defaultDrainTimeout = 10 * time.Minute
+	// maxDrainTimeout bounds how long a drain may wait
+	maxDrainTimeout = time.Hour
+	// nodeCordonTimeout bounds cordoning or uncordoning a node
+	nodeCordonTimeout = 30 * time.Second
+)
+
+var (
+	// ErrInvalidNodeMaintenance is returned for node names and drain options that cannot be used
+	ErrInvalidNodeMaintenance = errors.New("invalid node maintenance request")
+	// ErrNodeClusterNotFound is returned when the cluster does not exist
+	ErrNodeClusterNotFound = errors.New("cluster not found")
+	// ErrNodeMaintenanceFailed is returned when the cluster refuses to cordon or uncordon a node
+	ErrNodeMaintenanceFailed = errors.New("node maintenance failed")
+)
+
+// nodeNamePattern matches node names, which are DNS subdomains
+var nodeNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]{0,251}[a-z0-9])?$`)
+
+// NodeMaintenanceService takes the nodes of managed clusters in and out of
+// service for routine maintenance such as patching. Drains run as operations,
+// reporting how many of the node's pods are gone.
+type NodeMaintenanceService struct {
+	db         *gorm.DB
+	logger     *zap.Logger
+	operations *OperationService
+}
+
+// NewNodeMaintenanceService creates a new node maintenance service
+func NewNodeMaintenanceService(db *gorm.DB, logger *zap.Logger, operations *OperationService) *NodeMaintenanceService {
+	return &NodeMaintenanceService{db: db, logger: logger, operations: operations}
+}
+
+// Cordon marks a node unschedulable
+func (s *NodeMaintenanceService) Cordon(ctx context.Context, clusterID uuid.UUID, node string) error {
+	return s.setUnschedulable(ctx, clusterID, node, true)
+}
+
+// Uncordon makes a node schedulable again
+func (s *NodeMaintenanceService) Uncordon(ctx context.Context, clusterID uuid.UUID, node string) error {
+	return s.setUnschedulable(ctx, clusterID, node, false)
+}
+
+func (s *NodeMaintenanceService) setUnschedulable(ctx context.Context, clusterID uuid.UUID, node string, unschedulable bool) error {
+	if !nodeNamePattern.MatchString(node) {
+		return fmt.Errorf("%w: invalid node name", ErrInvalidNodeMaintenance)
+	}
+	cluster, err := s.find(clusterID)
+	if err != nil {
+		return err
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNodeMaintenanceFailed, err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, nodeCordonTimeout)
+	defer cancel()
+	if unschedulable {
+		err = client.CordonNode(ctx, node)
+	} else {
+		err = client.UncordonNode(ctx, node)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNodeMaintenanceFailed, err)
+	}
+	s.recordUnschedulable(cluster, node, unschedulable)
+	return nil
+}
+
+// Drain starts an operation that cordons the node and evicts its pods. The
+// node stays cordoned afterwards, until it is uncordoned.
+func (s *NodeMaintenanceService) Drain(userID, clusterID uuid.UUID, node string, req *model.DrainNodeRequest) (*model.Operation, error) {
+	if !nodeNamePattern.MatchString(node) {
+		return nil, fmt.Errorf("%w: invalid node name", ErrInvalidNodeMaintenance)
+	}
+	if req.GracePeriodSeconds != nil && *req.GracePeriodSeconds < 0 {
+		return nil, fmt.Errorf("%w: gracePeriodSeconds cannot be negative", ErrInvalidNodeMaintenance)
+	}
+	timeout := defaultDrainTimeout
+	if req.TimeoutSeconds != 0 {
+		timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+	if timeout <= 0 || timeout > maxDrainTimeout {
+		return nil, fmt.Errorf("%w: timeoutSeconds must be between 1 and %d", ErrInvalidNodeMaintenance, int(maxDrainTimeout/time.Second))
+	}
+	cluster, err := s.find(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := k8s.DrainOptions{
+		GracePeriodSeconds: req.GracePeriodSeconds,
+		IgnoreDaemonSets:   req.IgnoreDaemonSets,
+		DeleteEmptyDirData: req.DeleteEmptyDirData,
+		Force:              req.Force,
+		Timeout:            timeout,
+	}
+	return s.operations.Start(userID, OperationSpec{
+		Type:         model.OperationNodeDrain,
+		ResourceType: "cluster",
+		ResourceID:   &cluster.ID,
+		Message:      fmt.Sprintf("Draining node %s of %s", node, cluster.Name),
+		Cancellable:  true,
+		Timeout:      timeout + time.Minute,
+	}, func(ctx context.Context) (interface{}, error) {
+		return s.drain(ctx, cluster, node, opts)
+	})
+}
+
+// drain runs a drain for its operation
+func (s *NodeMaintenanceService) drain(ctx context.Context, cluster *model.K8sCluster, node string, opts k8s.DrainOptions) (*k8s.DrainResult, error) {
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	result, err := client.DrainNode(ctx, node, opts, func(percent int, message string) {
+		ReportProgress(ctx, percent, message)
+	})
+	if result != nil {
+		s.recordUnschedulable(cluster, node, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("Drained node",
+		zap.String("cluster", cluster.Name),
+		zap.String("node", node),
+		zap.Int("evicted", len(result.Evicted)),
+		zap.Int("skipped", len(result.Skipped)))
+	return result, nil
+}
+
+// recordUnschedulable updates the stored node until the next refresh reads it
+func (s *NodeMaintenanceService) recordUnschedulable(cluster *model.K8sCluster, node string, unschedulable bool) {
+	err := s.db.Model(&model.ClusterNode{}).Where("cluster_id = ? AND name = ?", cluster.ID, node).
+		Update("unschedulable", unschedulable).Error
+	if err != nil {
+		s.logger.Warn("failed to record node cordon state", zap.String("cluster", cluster.Name), zap.String("node", node), zap.Error(err))
+	}
+}
+
+// find loads a cluster
+func (s *NodeMaintenanceService) find(clusterID uuid.UUID) (*model.K8sCluster, error) {
+	var cluster model.K8sCluster
+	err := s.db.First(&cluster, "id = ?", clusterID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNodeClusterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cluster, nil
+}
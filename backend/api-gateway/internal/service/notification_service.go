@@ -2,19 +2,51 @@
 package service
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// notificationDigestInterval is how often queued notifications are checked for
+// a due digest or the end of quiet hours
+const notificationDigestInterval = time.Minute
+
+// notificationPreviewWindow is how far back a preference preview looks
+const notificationPreviewWindow = 24 * time.Hour
+
+// notificationDigestMaxListed caps the notifications listed in one digest
+const notificationDigestMaxListed = 50
+
+// notHeldForWeb excludes notifications waiting for a web digest or the end of
+// quiet hours from the notification list
+const notHeldForWeb = "id NOT IN (SELECT notification_id FROM notification_digest_items WHERE channel = 'web')"
+
+// notificationBulkLimit caps the notifications of one bulk action
+const notificationBulkLimit = 500
+
+// ErrInvalidNotificationPreference is returned for preferences that cannot be saved
+var ErrInvalidNotificationPreference = errors.New("invalid notification preference")
+
+// ErrInvalidNotificationRequest is returned for malformed searches and bulk actions
+var ErrInvalidNotificationRequest = errors.New("invalid notification request")
+
 // NotificationService handles notification creation and delivery
 type NotificationService struct {
 	db     *gorm.DB
 	logger *zap.Logger
+	mailer *Mailer
+	events *EventBus
 }
 
 // NewNotificationService creates a new notification service
@@ -25,8 +57,25 @@ func NewNotificationService(db *gorm.DB, logger *zap.Logger) *NotificationServic
 	}
 }
 
+// SetMailer sets the mailer email notifications are sent with. Only the
+// service running the digest worker needs one.
+func (s *NotificationService) SetMailer(mailer *Mailer) {
+	s.mailer = mailer
+}
+
+// SetEventBus sets the bus notification delivery and read state changes are
+// published on, so the user's open sessions stay in sync
+func (s *NotificationService) SetEventBus(events *EventBus) {
+	s.events = events
+}
+
 // CreateNotification creates a new notification
 func (s *NotificationService) CreateNotification(userID uuid.UUID, notifType model.NotificationType, title, message string, priority model.NotificationPriority) (*model.Notification, error) {
+	return s.CreateSourcedNotification(userID, notificationSource(notifType), notifType, title, message, priority)
+}
+
+// CreateSourcedNotification creates a new notification from a module
+func (s *NotificationService) CreateSourcedNotification(userID uuid.UUID, source model.NotificationSource, notifType model.NotificationType, title, message string, priority model.NotificationPriority) (*model.Notification, error) {
 	notification := &model.Notification{
 		ID:        uuid.New(),
 		UserID:    userID,
@@ -35,6 +84,7 @@ func (s *NotificationService) CreateNotification(userID uuid.UUID, notifType mod
 		Message:   message,
 		Priority:  priority,
 		Status:    model.NotificationStatusPending,
+		Source:    source,
 		Read:      false,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -51,6 +101,18 @@ func (s *NotificationService) CreateNotification(userID uuid.UUID, notifType mod
 	return notification, nil
 }
 
+// notificationSource returns the module notifications of a type come from when
+// the creator does not say
+func notificationSource(notifType model.NotificationType) model.NotificationSource {
+	switch notifType {
+	case model.NotificationTypeAlert:
+		return model.NotificationSourceAlerts
+	case model.NotificationTypeTask:
+		return model.NotificationSourceBatchTasks
+	}
+	return model.NotificationSourceSystem
+}
+
 // CreateBulkNotification creates notifications for multiple users
 func (s *NotificationService) CreateBulkNotification(userIDs []uuid.UUID, notifType model.NotificationType, title, message string, priority model.NotificationPriority) ([]*model.Notification, error) {
 	var notifications []*model.Notification
@@ -65,6 +127,7 @@ func (s *NotificationService) CreateBulkNotification(userIDs []uuid.UUID, notifT
 			Message:   message,
 			Priority:  priority,
 			Status:    model.NotificationStatusPending,
+			Source:    notificationSource(notifType),
 			Read:      false,
 			CreatedAt: now,
 			UpdatedAt: now,
@@ -88,7 +151,7 @@ func (s *NotificationService) CreateBulkNotification(userIDs []uuid.UUID, notifT
 // GetUserNotifications retrieves notifications for a user
 func (s *NotificationService) GetUserNotifications(userID uuid.UUID, limit int, unreadOnly bool) ([]model.Notification, error) {
 	var notifications []model.Notification
-	query := s.db.Where("user_id = ?", userID)
+	query := s.db.Where("user_id = ? AND archived = ?", userID, false).Where(notHeldForWeb)
 
 	if unreadOnly {
 		query = query.Where("read = ?", false)
@@ -102,11 +165,152 @@ func (s *NotificationService) GetUserNotifications(userID uuid.UUID, limit int,
 func (s *NotificationService) GetUnreadCount(userID uuid.UUID) (int64, error) {
 	var count int64
 	err := s.db.Model(&model.Notification{}).
-		Where("user_id = ? AND read = ?", userID, false).
+		Where("user_id = ? AND read = ? AND archived = ?", userID, false, false).
+		Where(notHeldForWeb).
 		Count(&count).Error
 	return count, err
 }
 
+// SearchNotifications returns a page of the user's notifications matching the
+// filter, newest first. Search matches whole words of the title and message,
+// or part of the title.
+func (s *NotificationService) SearchNotifications(userID uuid.UUID, filter *model.NotificationFilter) (*model.NotificationPage, error) {
+	query := s.db.Where("user_id = ? AND archived = ?", userID, filter.Archived).Where(notHeldForWeb)
+	if search := strings.TrimSpace(filter.Search); search != "" {
+		query = query.Where("(to_tsvector('simple', title || ' ' || coalesce(message, '')) @@ plainto_tsquery('simple', ?) OR title ILIKE ?)",
+			search, sanitize.Contains(search))
+	}
+	if len(filter.Sources) > 0 {
+		query = query.Where("source IN ?", filter.Sources)
+	}
+	if len(filter.Types) > 0 {
+		query = query.Where("type IN ?", filter.Types)
+	}
+	if len(filter.Priorities) > 0 {
+		query = query.Where("priority IN ?", filter.Priorities)
+	}
+	if filter.Read != nil {
+		query = query.Where("read = ?", *filter.Read)
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := decodeNotificationCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("(created_at < ? OR (created_at = ? AND id < ?))", createdAt, createdAt, id)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	// One more than the page tells whether there is a next page
+	var notifications []model.Notification
+	if err := query.Order("created_at DESC, id DESC").Limit(limit + 1).Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+
+	page := &model.NotificationPage{Notifications: notifications}
+	if len(notifications) > limit {
+		page.Notifications = notifications[:limit]
+		last := page.Notifications[limit-1]
+		page.NextCursor = encodeNotificationCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+// encodeNotificationCursor encodes the position after a notification
+func encodeNotificationCursor(createdAt time.Time, id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(createdAt.UnixNano(), 10) + "_" + id.String()))
+}
+
+// decodeNotificationCursor decodes a cursor made by encodeNotificationCursor
+func decodeNotificationCursor(cursor string) (time.Time, uuid.UUID, error) {
+	invalid := fmt.Errorf("%w: invalid cursor", ErrInvalidNotificationRequest)
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	nanos, rawID, ok := strings.Cut(string(raw), "_")
+	if !ok {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	return time.Unix(0, n), id, nil
+}
+
+// UpdateNotifications applies a bulk action to the user's notifications among
+// ids and returns how many it changed. The change is published so the user's
+// other sessions can follow it.
+func (s *NotificationService) UpdateNotifications(userID uuid.UUID, action string, ids []uuid.UUID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, fmt.Errorf("%w: ids are required", ErrInvalidNotificationRequest)
+	}
+	if len(ids) > notificationBulkLimit {
+		return 0, fmt.Errorf("%w: at most %d notifications can be changed at once", ErrInvalidNotificationRequest, notificationBulkLimit)
+	}
+
+	now := time.Now()
+	query := s.db.Model(&model.Notification{}).Where("user_id = ? AND id IN ?", userID, ids)
+	var result *gorm.DB
+	switch action {
+	case model.NotificationActionRead:
+		result = query.Updates(map[string]interface{}{"read": true, "read_at": &now, "updated_at": now})
+	case model.NotificationActionUnread:
+		result = query.Updates(map[string]interface{}{"read": false, "read_at": nil, "updated_at": now})
+	case model.NotificationActionArchive:
+		result = query.Updates(map[string]interface{}{"archived": true, "archived_at": &now, "updated_at": now})
+	case model.NotificationActionUnarchive:
+		result = query.Updates(map[string]interface{}{"archived": false, "archived_at": nil, "updated_at": now})
+	case model.NotificationActionDelete:
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("notification_id IN (?)", tx.Model(&model.Notification{}).Select("id").
+				Where("user_id = ? AND id IN ?", userID, ids)).Delete(&model.NotificationDigestItem{}).Error; err != nil {
+				return err
+			}
+			result = tx.Where("user_id = ? AND id IN ?", userID, ids).Delete(&model.Notification{})
+			return result.Error
+		})
+		if err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("%w: unknown action %q", ErrInvalidNotificationRequest, action)
+	}
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		s.publishUpdate(userID, action, ids)
+	}
+	return result.RowsAffected, nil
+}
+
+// publishUpdate publishes a change of the user's notifications with the new
+// unread count
+func (s *NotificationService) publishUpdate(userID uuid.UUID, action string, ids []uuid.UUID) {
+	if s.events == nil {
+		return
+	}
+	unread, err := s.GetUnreadCount(userID)
+	if err != nil {
+		s.logger.Warn("failed to count unread notifications", zap.String("user_id", userID.String()), zap.Error(err))
+	}
+	s.events.Publish(userID, model.EventNotificationsUpdated, map[string]string{"action": action}, &model.NotificationsUpdate{
+		Action:      action,
+		IDs:         ids,
+		UnreadCount: unread,
+	})
+}
+
 // MarkAsRead marks a notification as read
 func (s *NotificationService) MarkAsRead(notificationID uuid.UUID) error {
 	now := time.Now()
@@ -122,17 +326,24 @@ func (s *NotificationService) MarkAsRead(notificationID uuid.UUID) error {
 // MarkAllAsRead marks all notifications for a user as read
 func (s *NotificationService) MarkAllAsRead(userID uuid.UUID) error {
 	now := time.Now()
-	return s.db.Model(&model.Notification{}).
+	err := s.db.Model(&model.Notification{}).
 		Where("user_id = ? AND read = ?", userID, false).
 		Updates(map[string]interface{}{
 			"read":       true,
 			"read_at":    &now,
 			"updated_at": time.Now(),
 		}).Error
+	if err == nil {
+		s.publishUpdate(userID, model.NotificationActionRead, nil)
+	}
+	return err
 }
 
 // DeleteNotification deletes a notification
 func (s *NotificationService) DeleteNotification(notificationID uuid.UUID) error {
+	if err := s.db.Delete(&model.NotificationDigestItem{}, "notification_id = ?", notificationID).Error; err != nil {
+		return err
+	}
 	return s.db.Delete(&model.Notification{}, "id = ?", notificationID).Error
 }
 
@@ -151,6 +362,9 @@ func (s *NotificationService) GetNotificationPreference(userID uuid.UUID) (*mode
 			AlertTypes:   []model.NotificationType{model.NotificationTypeAlert, model.NotificationTypeSystem, model.NotificationTypeSecurity},
 			MinPriority:  model.NotificationPriorityMedium,
 			Timezone:     "UTC",
+			WebDigest:    model.DigestModeOff,
+			EmailDigest:  model.DigestModeOff,
+			DigestHour:   9,
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 		}
@@ -161,10 +375,58 @@ func (s *NotificationService) GetNotificationPreference(userID uuid.UUID) (*mode
 
 // UpdateNotificationPreference updates user notification preferences
 func (s *NotificationService) UpdateNotificationPreference(pref *model.NotificationPreference) error {
+	if err := validateNotificationPreference(pref); err != nil {
+		return err
+	}
+	current, err := s.GetNotificationPreference(pref.UserID)
+	if err != nil {
+		return err
+	}
+	pref.ID = current.ID
+	pref.CreatedAt = current.CreatedAt
 	pref.UpdatedAt = time.Now()
 	return s.db.Save(pref).Error
 }
 
+// validateNotificationPreference checks the quiet hours, timezone and digest
+// settings, and fills in the defaults of those left empty
+func validateNotificationPreference(pref *model.NotificationPreference) error {
+	if (pref.QuietHoursStart == "") != (pref.QuietHoursEnd == "") {
+		return fmt.Errorf("%w: quiet hours need both a start and an end", ErrInvalidNotificationPreference)
+	}
+	for _, clock := range []string{pref.QuietHoursStart, pref.QuietHoursEnd} {
+		if _, ok := parseClock(clock); clock != "" && !ok {
+			return fmt.Errorf("%w: quiet hours must be in HH:MM format", ErrInvalidNotificationPreference)
+		}
+	}
+	if pref.Timezone == "" {
+		pref.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(pref.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidNotificationPreference, pref.Timezone)
+	}
+	for _, mode := range []*string{&pref.WebDigest, &pref.EmailDigest} {
+		switch *mode {
+		case "":
+			*mode = model.DigestModeOff
+		case model.DigestModeOff, model.DigestModeHourly, model.DigestModeDaily:
+		default:
+			return fmt.Errorf("%w: unknown digest mode %q", ErrInvalidNotificationPreference, *mode)
+		}
+	}
+	if pref.DigestHour < 0 || pref.DigestHour > 23 {
+		return fmt.Errorf("%w: digest hour must be between 0 and 23", ErrInvalidNotificationPreference)
+	}
+	switch pref.ImmediatePriority {
+	case "":
+		pref.ImmediatePriority = model.NotificationPriorityCritical
+	case model.NotificationPriorityLow, model.NotificationPriorityMedium, model.NotificationPriorityHigh, model.NotificationPriorityCritical:
+	default:
+		return fmt.Errorf("%w: unknown priority %q", ErrInvalidNotificationPreference, pref.ImmediatePriority)
+	}
+	return nil
+}
+
 // deliverNotification handles the actual delivery of a notification
 func (s *NotificationService) deliverNotification(notification *model.Notification) {
 	// Get user preferences
@@ -183,18 +445,65 @@ func (s *NotificationService) deliverNotification(notification *model.Notificati
 		return
 	}
 
-	// Mark as sent
+	// Notifications at or above the immediate priority skip digests and quiet
+	// hours; the others wait in the channel's queue when it is digested or
+	// quiet hours are on
+	now := time.Now()
+	immediate := s.priorityMatches(notification.Priority, immediatePriority(pref))
+	held := !immediate && isInQuietHours(pref, now)
+
+	if pref.WebEnabled {
+		if immediate || (!held && pref.DigestMode(model.NotificationChannelWeb) == model.DigestModeOff) {
+			s.markSent(notification)
+		} else {
+			s.queueDigestItem(notification, model.NotificationChannelWeb, false)
+		}
+	}
+
+	// Email always goes through the queue, as only the digest worker sends it
+	if pref.EmailEnabled {
+		s.queueDigestItem(notification, model.NotificationChannelEmail, immediate)
+	}
+
+	s.logger.Info("Notification delivered",
+		zap.String("notification_id", notification.ID.String()),
+		zap.String("user_id", notification.UserID.String()),
+		zap.Bool("immediate", immediate),
+		zap.Bool("quiet_hours", held))
+}
+
+// markSent marks a notification delivered on the web channel
+func (s *NotificationService) markSent(notification *model.Notification) {
 	notification.Status = model.NotificationStatusSent
 	notification.UpdatedAt = time.Now()
 	s.db.Save(notification)
+	s.logDelivery(notification.ID, model.NotificationChannelWeb, model.NotificationStatusDelivered)
+	s.publishDelivered(notification)
+}
 
-	// Log delivery
-	s.logDelivery(notification.ID, "web", model.NotificationStatusDelivered)
+// publishDelivered publishes a notification that reached the notification center
+func (s *NotificationService) publishDelivered(notification *model.Notification) {
+	s.events.Publish(notification.UserID, model.EventNotificationDelivered, map[string]string{
+		"source":   string(notification.Source),
+		"type":     string(notification.Type),
+		"priority": string(notification.Priority),
+	}, notification)
+}
 
-	// TODO: Implement actual delivery channels (email, push, etc.)
-	s.logger.Info("Notification delivered",
-		zap.String("notification_id", notification.ID.String()),
-		zap.String("user_id", notification.UserID.String()))
+// queueDigestItem queues a notification for the next digest of a channel
+func (s *NotificationService) queueDigestItem(notification *model.Notification, channel string, immediate bool) {
+	item := &model.NotificationDigestItem{
+		UserID:         notification.UserID,
+		Channel:        channel,
+		NotificationID: notification.ID,
+		Immediate:      immediate,
+	}
+	if err := s.db.Create(item).Error; err != nil {
+		s.logger.Error("Failed to queue notification",
+			zap.String("notification_id", notification.ID.String()),
+			zap.String("channel", channel),
+			zap.Error(err))
+	}
 }
 
 // shouldDeliver checks if a notification should be delivered based on preferences
@@ -218,11 +527,6 @@ func (s *NotificationService) shouldDeliver(notification *model.Notification, pr
 		}
 	}
 
-	// Check quiet hours
-	if s.isInQuietHours(pref) {
-		return false
-	}
-
 	return true
 }
 
@@ -237,14 +541,61 @@ func (s *NotificationService) priorityMatches(notificationMin, userMin model.Not
 	return priorityOrder[notificationMin] >= priorityOrder[userMin]
 }
 
-// isInQuietHours checks if current time is within quiet hours
-func (s *NotificationService) isInQuietHours(pref *model.NotificationPreference) bool {
-	if pref.QuietHoursStart == "" || pref.QuietHoursEnd == "" {
-		return false
+// isInQuietHours checks if a time is within the quiet hours of the preference
+func isInQuietHours(pref *model.NotificationPreference, t time.Time) bool {
+	return quietHoursEnd(pref, t).After(t)
+}
+
+// quietHoursEnd returns when the quiet hours t falls in end, or t when it is
+// outside them. Quiet hours are in the preference's timezone and may span
+// midnight, e.g. 22:00 to 07:00.
+func quietHoursEnd(pref *model.NotificationPreference, t time.Time) time.Time {
+	start, okStart := parseClock(pref.QuietHoursStart)
+	end, okEnd := parseClock(pref.QuietHoursEnd)
+	if !okStart || !okEnd || start == end {
+		return t
+	}
+
+	local := t.In(preferenceLocation(pref))
+	minute := local.Hour()*60 + local.Minute()
+	endOn := func(days int) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day()+days, end/60, end%60, 0, 0, local.Location())
+	}
+	switch {
+	case start < end && minute >= start && minute < end:
+		return endOn(0)
+	case start > end && minute >= start:
+		return endOn(1)
+	case start > end && minute < end:
+		return endOn(0)
 	}
+	return t
+}
+
+// parseClock parses an HH:MM time into minutes after midnight
+func parseClock(clock string) (int, bool) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
 
-	// TODO: Implement timezone-aware quiet hours check
-	return false
+// preferenceLocation returns the timezone of the preference, UTC when unknown
+func preferenceLocation(pref *model.NotificationPreference) *time.Location {
+	if loc, err := time.LoadLocation(pref.Timezone); err == nil && pref.Timezone != "" {
+		return loc
+	}
+	return time.UTC
+}
+
+// immediatePriority returns the priority from which notifications skip digests
+// and quiet hours
+func immediatePriority(pref *model.NotificationPreference) model.NotificationPriority {
+	if pref.ImmediatePriority == "" {
+		return model.NotificationPriorityCritical
+	}
+	return pref.ImmediatePriority
 }
 
 // logDelivery logs notification delivery
@@ -317,6 +668,15 @@ func (s *NotificationService) GetNotificationStats(userID uuid.UUID) (map[string
 
 // CreateAlertNotification creates a notification from an alert
 func (s *NotificationService) CreateAlertNotification(userID uuid.UUID, alertTitle, alertMessage string, severity string, alertID string) error {
+	// Alerts held by a silence or maintenance window do not notify
+	if id, err := uuid.Parse(alertID); err == nil {
+		var alert model.Alert
+		if s.db.Select("status", "silenced_until").First(&alert, "id = ?", id).Error == nil &&
+			alert.Status == model.AlertStatusSilenced && alert.SilencedUntil != nil && time.Now().Before(*alert.SilencedUntil) {
+			return nil
+		}
+	}
+
 	priority := model.NotificationPriorityLow
 	switch severity {
 	case "critical":
@@ -327,8 +687,9 @@ func (s *NotificationService) CreateAlertNotification(userID uuid.UUID, alertTit
 		priority = model.NotificationPriorityMedium
 	}
 
-	_, err := s.CreateNotification(
+	_, err := s.CreateSourcedNotification(
 		userID,
+		model.NotificationSourceAlerts,
 		model.NotificationTypeAlert,
 		alertTitle,
 		alertMessage,
@@ -353,8 +714,9 @@ func (s *NotificationService) CreateTaskNotification(userID uuid.UUID, taskName,
 		priority = model.NotificationPriorityHigh
 	}
 
-	_, err := s.CreateNotification(
+	_, err := s.CreateSourcedNotification(
 		userID,
+		model.NotificationSourceBatchTasks,
 		model.NotificationTypeTask,
 		title,
 		message,
@@ -380,3 +742,303 @@ func (s *NotificationService) CreateSystemNotification(title, message string, pr
 	_, err = s.CreateBulkNotification(userIDs, model.NotificationTypeSystem, title, message, priority)
 	return err
 }
+
+// Run delivers queued notifications until ctx is cancelled
+func (s *NotificationService) Run(ctx context.Context) {
+	ticker := time.NewTicker(notificationDigestInterval)
+	defer ticker.Stop()
+
+	for {
+		s.FlushDigests(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// FlushDigests sends the immediate email and every channel queue whose digest
+// is due and whose quiet hours are over. Queued items are claimed by deleting
+// them, so each is delivered once even with several gateway replicas.
+func (s *NotificationService) FlushDigests(now time.Time) {
+	var immediate []model.NotificationDigestItem
+	if err := s.db.Clauses(clause.Returning{}).
+		Where("immediate = ?", true).
+		Delete(&immediate).Error; err != nil {
+		s.logger.Error("failed to claim immediate notifications", zap.Error(err))
+		return
+	}
+	for _, item := range immediate {
+		s.sendEmail(item.UserID, []model.NotificationDigestItem{item}, "")
+	}
+
+	var queues []struct {
+		UserID  uuid.UUID
+		Channel string
+		Oldest  time.Time
+	}
+	if err := s.db.Model(&model.NotificationDigestItem{}).
+		Select("user_id, channel, MIN(created_at) AS oldest").
+		Where("immediate = ?", false).
+		Group("user_id, channel").
+		Scan(&queues).Error; err != nil {
+		s.logger.Error("failed to load notification digests", zap.Error(err))
+		return
+	}
+
+	for _, queue := range queues {
+		pref, err := s.GetNotificationPreference(queue.UserID)
+		if err != nil {
+			s.logger.Error("failed to get notification preference", zap.String("user_id", queue.UserID.String()), zap.Error(err))
+			continue
+		}
+		if now.Before(nextDigestAt(pref, queue.Channel, queue.Oldest)) {
+			continue
+		}
+
+		var items []model.NotificationDigestItem
+		if err := s.db.Clauses(clause.Returning{}).
+			Where("user_id = ? AND channel = ? AND immediate = ? AND created_at <= ?", queue.UserID, queue.Channel, false, now).
+			Delete(&items).Error; err != nil {
+			s.logger.Error("failed to claim notification digest", zap.String("user_id", queue.UserID.String()), zap.Error(err))
+			continue
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		mode := pref.DigestMode(queue.Channel)
+		if queue.Channel == model.NotificationChannelWeb {
+			s.sendWebDigest(queue.UserID, items, mode)
+		} else {
+			s.sendEmail(queue.UserID, items, mode)
+		}
+	}
+}
+
+// nextDigestAt returns when a channel queue whose oldest item was queued at
+// oldest is delivered: at the end of the hour or on the next digest hour for
+// digested channels, right away otherwise, and never before quiet hours end
+func nextDigestAt(pref *model.NotificationPreference, channel string, oldest time.Time) time.Time {
+	due := oldest
+	switch pref.DigestMode(channel) {
+	case model.DigestModeHourly:
+		due = oldest.Truncate(time.Hour).Add(time.Hour)
+	case model.DigestModeDaily:
+		local := oldest.In(preferenceLocation(pref))
+		due = time.Date(local.Year(), local.Month(), local.Day(), pref.DigestHour, 0, 0, 0, local.Location())
+		if !due.After(oldest) {
+			due = due.AddDate(0, 0, 1)
+		}
+	}
+	return quietHoursEnd(pref, due)
+}
+
+// queuedNotifications loads the notifications of claimed items, oldest first.
+// Items of notifications deleted meanwhile are dropped.
+func (s *NotificationService) queuedNotifications(items []model.NotificationDigestItem) ([]model.Notification, error) {
+	ids := make([]uuid.UUID, len(items))
+	for i, item := range items {
+		ids[i] = item.NotificationID
+	}
+	var notifications []model.Notification
+	err := s.db.Where("id IN ?", ids).Order("created_at").Find(&notifications).Error
+	return notifications, err
+}
+
+// sendWebDigest releases the notifications held for the web channel. A
+// digested channel gets one digest notification listing them, and the held
+// ones are marked read.
+func (s *NotificationService) sendWebDigest(userID uuid.UUID, items []model.NotificationDigestItem, mode string) {
+	notifications, err := s.queuedNotifications(items)
+	if err != nil {
+		s.logger.Error("failed to load queued notifications", zap.String("user_id", userID.String()), zap.Error(err))
+		return
+	}
+	if len(notifications) == 0 {
+		return
+	}
+
+	if mode == model.DigestModeOff || len(notifications) == 1 {
+		for i := range notifications {
+			s.markSent(&notifications[i])
+		}
+		return
+	}
+
+	now := time.Now()
+	ids := make([]uuid.UUID, len(notifications))
+	for i := range notifications {
+		ids[i] = notifications[i].ID
+	}
+	if err := s.db.Model(&model.Notification{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"status":     model.NotificationStatusSent,
+		"read":       true,
+		"read_at":    &now,
+		"updated_at": now,
+	}).Error; err != nil {
+		s.logger.Error("failed to release digested notifications", zap.String("user_id", userID.String()), zap.Error(err))
+		return
+	}
+
+	title, message := digestText(notifications, mode)
+	digest := &model.Notification{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Type:      model.NotificationTypeInfo,
+		Title:     title,
+		Message:   message,
+		Priority:  s.digestPriority(notifications),
+		Status:    model.NotificationStatusSent,
+		Source:    model.NotificationSourceSystem,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.db.Create(digest).Error; err != nil {
+		s.logger.Error("failed to create notification digest", zap.String("user_id", userID.String()), zap.Error(err))
+		return
+	}
+	s.logDelivery(digest.ID, model.NotificationChannelWeb, model.NotificationStatusDelivered)
+	s.publishDelivered(digest)
+}
+
+// sendEmail emails the queued notifications to the user, one at a time or as
+// one digest
+func (s *NotificationService) sendEmail(userID uuid.UUID, items []model.NotificationDigestItem, mode string) {
+	notifications, err := s.queuedNotifications(items)
+	if err != nil {
+		s.logger.Error("failed to load queued notifications", zap.String("user_id", userID.String()), zap.Error(err))
+		return
+	}
+	if len(notifications) == 0 {
+		return
+	}
+
+	status := model.NotificationStatusDelivered
+	defer func() {
+		for i := range notifications {
+			s.logDelivery(notifications[i].ID, model.NotificationChannelEmail, status)
+		}
+	}()
+
+	var user model.User
+	if err := s.db.Select("email").First(&user, "id = ?", userID).Error; err != nil || user.Email == "" || !s.mailer.Configured() {
+		status = model.NotificationStatusFailed
+		return
+	}
+
+	var sendErr error
+	if mode == model.DigestModeOff || len(notifications) == 1 {
+		sendErr = s.mailer.Send(user.Email, "[MyOps] "+notifications[0].Title, notifications[0].Message)
+		for i := 1; i < len(notifications) && sendErr == nil; i++ {
+			sendErr = s.mailer.Send(user.Email, "[MyOps] "+notifications[i].Title, notifications[i].Message)
+		}
+	} else {
+		title, message := digestText(notifications, mode)
+		sendErr = s.mailer.Send(user.Email, "[MyOps] "+title, message)
+	}
+	if sendErr != nil {
+		status = model.NotificationStatusFailed
+		s.logger.Warn("failed to email notifications", zap.String("user_id", userID.String()), zap.Error(sendErr))
+	}
+}
+
+// digestText builds the title and message of a digest
+func digestText(notifications []model.Notification, mode string) (string, string) {
+	title := fmt.Sprintf("%d notifications in your %s digest", len(notifications), mode)
+
+	var b strings.Builder
+	for i, n := range notifications {
+		if i == notificationDigestMaxListed {
+			fmt.Fprintf(&b, "... and %d more\n", len(notifications)-i)
+			break
+		}
+		fmt.Fprintf(&b, "- [%s] %s (%s)\n", n.Priority, n.Title, n.CreatedAt.UTC().Format("2006-01-02 15:04 MST"))
+		if n.Message != "" {
+			fmt.Fprintf(&b, "  %s\n", n.Message)
+		}
+	}
+	return title, b.String()
+}
+
+// digestPriority returns the highest priority of the digested notifications
+func (s *NotificationService) digestPriority(notifications []model.Notification) model.NotificationPriority {
+	priority := model.NotificationPriorityLow
+	for i := range notifications {
+		if s.priorityMatches(notifications[i].Priority, priority) {
+			priority = notifications[i].Priority
+		}
+	}
+	return priority
+}
+
+// PreviewNotificationPreference classifies the user's notifications of the last
+// day by what the preference would have done with them on each channel
+func (s *NotificationService) PreviewNotificationPreference(userID uuid.UUID, pref *model.NotificationPreference, now time.Time) (*model.NotificationDigestPreview, error) {
+	if err := validateNotificationPreference(pref); err != nil {
+		return nil, err
+	}
+
+	since := now.Add(-notificationPreviewWindow)
+	var notifications []model.Notification
+	if err := s.db.Where("user_id = ? AND created_at >= ?", userID, since).
+		Order("created_at DESC").
+		Limit(200).
+		Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+
+	enabled := map[string]bool{
+		model.NotificationChannelWeb:   pref.WebEnabled,
+		model.NotificationChannelEmail: pref.EmailEnabled,
+	}
+	preview := &model.NotificationDigestPreview{
+		Since:    since,
+		Channels: make(map[string]model.NotificationChannelPreview, len(enabled)),
+		Items:    make([]model.NotificationPreviewItem, 0, len(notifications)),
+	}
+	for channel := range enabled {
+		counts := model.NotificationChannelPreview{Mode: pref.DigestMode(channel)}
+		if counts.Mode != model.DigestModeOff {
+			next := nextDigestAt(pref, channel, now)
+			counts.NextDigestAt = &next
+		}
+		preview.Channels[channel] = counts
+	}
+
+	for i := range notifications {
+		n := &notifications[i]
+		item := model.NotificationPreviewItem{
+			NotificationID: n.ID,
+			Title:          n.Title,
+			Type:           n.Type,
+			Priority:       n.Priority,
+			CreatedAt:      n.CreatedAt,
+			Channels:       make(map[string]string, len(enabled)),
+		}
+		for channel, on := range enabled {
+			counts := preview.Channels[channel]
+			outcome := model.NotificationOutcomeImmediate
+			switch {
+			case !on || !s.shouldDeliver(n, pref):
+				outcome = model.NotificationOutcomeSkipped
+				counts.Skipped++
+			case s.priorityMatches(n.Priority, immediatePriority(pref)):
+				counts.Immediate++
+			case isInQuietHours(pref, n.CreatedAt):
+				outcome = model.NotificationOutcomeQuietHours
+				counts.QuietHours++
+			case counts.Mode != model.DigestModeOff:
+				outcome = model.NotificationOutcomeDigest
+				counts.Digested++
+			default:
+				counts.Immediate++
+			}
+			item.Channels[channel] = outcome
+			preview.Channels[channel] = counts
+		}
+		preview.Items = append(preview.Items, item)
+	}
+	return preview, nil
+}
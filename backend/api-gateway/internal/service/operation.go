@@ -0,0 +1,385 @@
+// Package service provides long-running operations, the shared tracking of work
+// that outlives the request starting it
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// operationHeartbeatInterval is how often a running operation proves it is
+	// alive and picks up cancellations requested on other instances
+	operationHeartbeatInterval = 15 * time.Second
+	// operationStaleAfter is how long a running operation may miss heartbeats
+	// before it is failed as interrupted
+	operationStaleAfter = 2 * time.Minute
+	// operationSweepInterval is how often stale and expired operations are handled
+	operationSweepInterval = time.Minute
+)
+
+var (
+	// ErrOperationNotFound is returned when the user has no such operation
+	ErrOperationNotFound = errors.New("operation not found")
+	// ErrOperationDone is returned when cancelling an operation that has finished
+	ErrOperationDone = errors.New("operation already finished")
+	// ErrOperationNotCancellable is returned when cancelling an operation that
+	// cannot be stopped part way
+	ErrOperationNotCancellable = errors.New("operation cannot be cancelled")
+)
+
+// OperationSpec describes an operation to start
+type OperationSpec struct {
+	Type         model.OperationKind
+	ResourceType string
+	ResourceID   *uuid.UUID
+	Message      string        // What the operation is doing at first
+	Cancellable  bool          // Whether the work stops when its context is cancelled
+	Timeout      time.Duration // No limit when 0
+}
+
+// OperationFunc is the work of an operation. It reports progress through the
+// context, with ReportProgress, stops when the context is cancelled, and returns
+// the result stored with the operation.
+type OperationFunc func(ctx context.Context) (interface{}, error)
+
+// operationProgressKey is the context key of the running operation
+type operationProgressKey struct{}
+
+// operationRun is an operation running on this instance
+type operationRun struct {
+	service   *OperationService
+	operation model.Operation
+	cancel    context.CancelFunc
+	cancelled atomic.Bool // Cancelled on request rather than by a timeout
+}
+
+// OperationService starts, tracks and cancels long-running operations. Each
+// operation runs in a goroutine of the instance that started it, which keeps
+// the operations table up to date; any instance answers polls and takes
+// cancellations, and operations whose instance stopped are failed once their
+// heartbeats stop.
+type OperationService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	settings *SettingsService
+	events   *EventBus
+
+	mu      sync.Mutex
+	running map[uuid.UUID]*operationRun
+}
+
+// NewOperationService creates a new operation service
+func NewOperationService(db *gorm.DB, logger *zap.Logger, settings *SettingsService) *OperationService {
+	return &OperationService{db: db, logger: logger, settings: settings, running: make(map[uuid.UUID]*operationRun)}
+}
+
+// SetEventBus sets the bus operation progress and completion events are published on
+func (s *OperationService) SetEventBus(events *EventBus) {
+	s.events = events
+}
+
+// Start records an operation for the user and runs it in the background,
+// returning it as recorded
+func (s *OperationService) Start(userID uuid.UUID, spec OperationSpec, run OperationFunc) (*model.Operation, error) {
+	now := time.Now()
+	operation := model.Operation{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Type:         spec.Type,
+		Status:       model.OperationRunning,
+		Message:      spec.Message,
+		ResourceType: spec.ResourceType,
+		ResourceID:   spec.ResourceID,
+		Cancellable:  spec.Cancellable,
+		StartedAt:    &now,
+		HeartbeatAt:  &now,
+	}
+	if err := s.db.Create(&operation).Error; err != nil {
+		return nil, fmt.Errorf("failed to create operation: %w", err)
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if spec.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), spec.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	op := &operationRun{service: s, operation: operation, cancel: cancel}
+	s.mu.Lock()
+	s.running[operation.ID] = op
+	s.mu.Unlock()
+
+	go s.run(context.WithValue(ctx, operationProgressKey{}, op), op, run)
+	return &operation, nil
+}
+
+// run runs the work of an operation and records how it ended
+func (s *OperationService) run(ctx context.Context, op *operationRun, run OperationFunc) {
+	defer func() {
+		op.cancel()
+		s.mu.Lock()
+		delete(s.running, op.operation.ID)
+		s.mu.Unlock()
+	}()
+
+	stopHeartbeat := make(chan struct{})
+	go s.heartbeat(op, stopHeartbeat)
+	defer close(stopHeartbeat)
+
+	result, err := func() (result interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				s.logger.Error("operation panicked", zap.String("operationId", op.operation.ID.String()),
+					zap.String("type", string(op.operation.Type)), zap.Any("error", p), zap.String("stack", string(debug.Stack())))
+				err = fmt.Errorf("operation panicked: %v", p)
+			}
+		}()
+		return run(ctx)
+	}()
+
+	updates := map[string]interface{}{"completed_at": time.Now()}
+	// Work that finished despite a cancellation still succeeded
+	switch {
+	case op.cancelled.Load() && err != nil:
+		updates["status"] = model.OperationCancelled
+		updates["message"] = "Cancelled"
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) && err != nil:
+		updates["status"] = model.OperationFailed
+		updates["error"] = "operation timed out"
+	case err != nil:
+		updates["status"] = model.OperationFailed
+		updates["error"] = err.Error()
+	default:
+		updates["status"] = model.OperationSucceeded
+		updates["progress"] = 100
+		if result != nil {
+			data, err := json.Marshal(result)
+			if err != nil {
+				s.logger.Error("failed to encode operation result", zap.String("operationId", op.operation.ID.String()), zap.Error(err))
+			} else {
+				updates["result"] = data
+			}
+		}
+	}
+
+	if err := s.db.Model(&model.Operation{}).Where("id = ?", op.operation.ID).Updates(updates).Error; err != nil {
+		s.logger.Error("failed to record operation outcome", zap.String("operationId", op.operation.ID.String()), zap.Error(err))
+		return
+	}
+	s.publish(op.operation.ID, model.EventOperationFinished)
+}
+
+// heartbeat keeps a running operation from being failed as stale and cancels it
+// when a cancellation was requested on another instance
+func (s *OperationService) heartbeat(op *operationRun, stop <-chan struct{}) {
+	ticker := time.NewTicker(operationHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		s.db.Model(&model.Operation{}).Where("id = ?", op.operation.ID).UpdateColumn("heartbeat_at", time.Now())
+
+		var requested []bool
+		s.db.Model(&model.Operation{}).Where("id = ?", op.operation.ID).Pluck("cancel_requested", &requested)
+		if len(requested) == 1 && requested[0] {
+			op.stop()
+		}
+	}
+}
+
+// stop cancels the operation's work at the user's request
+func (op *operationRun) stop() {
+	op.cancelled.Store(true)
+	op.cancel()
+}
+
+// ReportProgress records the progress, a percentage, and current step of the
+// operation running with ctx. It is a no-op outside of an operation, so work
+// run both as an operation and directly can report unconditionally.
+func ReportProgress(ctx context.Context, percent int, message string) {
+	op, ok := ctx.Value(operationProgressKey{}).(*operationRun)
+	if !ok {
+		return
+	}
+	// 100 is reserved for operations that succeeded
+	if percent < 0 {
+		percent = 0
+	} else if percent > 99 {
+		percent = 99
+	}
+	s := op.service
+	if err := s.db.Model(&model.Operation{}).Where("id = ?", op.operation.ID).
+		Updates(map[string]interface{}{"progress": percent, "message": message}).Error; err != nil {
+		s.logger.Warn("failed to record operation progress", zap.String("operationId", op.operation.ID.String()), zap.Error(err))
+		return
+	}
+	s.publish(op.operation.ID, model.EventOperationProgress)
+}
+
+// publish publishes an operation event with the operation as its data
+func (s *OperationService) publish(id uuid.UUID, eventType model.EventType) {
+	if s.events == nil {
+		return
+	}
+	var operation model.Operation
+	if err := s.db.Where("id = ?", id).First(&operation).Error; err != nil {
+		return
+	}
+	attrs := map[string]string{
+		"operationId": operation.ID.String(),
+		"type":        string(operation.Type),
+		"status":      string(operation.Status),
+	}
+	if operation.ResourceID != nil {
+		attrs["resourceId"] = operation.ResourceID.String()
+	}
+	s.events.Publish(operation.UserID, eventType, attrs, operation)
+}
+
+// Get returns one of the user's operations
+func (s *OperationService) Get(userID, id uuid.UUID) (*model.Operation, error) {
+	var operation model.Operation
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&operation).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOperationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &operation, nil
+}
+
+// List returns a page of the user's operations, newest first, and their total
+func (s *OperationService) List(userID uuid.UUID, filter model.OperationFilter, page, pageSize int) ([]model.Operation, int64, error) {
+	query := s.db.Model(&model.Operation{}).Where("user_id = ?", userID)
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.ResourceID != nil {
+		query = query.Where("resource_id = ?", *filter.ResourceID)
+	}
+	if filter.Active {
+		query = query.Where("status IN ?", []model.OperationStatus{model.OperationPending, model.OperationRunning})
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	operations := []model.Operation{}
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&operations).Error; err != nil {
+		return nil, 0, err
+	}
+	return operations, total, nil
+}
+
+// Cancel requests that one of the user's operations stop. An operation running
+// on this instance is stopped at once; one running elsewhere on its next heartbeat.
+func (s *OperationService) Cancel(userID, id uuid.UUID) (*model.Operation, error) {
+	operation, err := s.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if operation.Status.Done() {
+		return nil, ErrOperationDone
+	}
+	if !operation.Cancellable {
+		return nil, ErrOperationNotCancellable
+	}
+
+	if err := s.db.Model(operation).UpdateColumn("cancel_requested", true).Error; err != nil {
+		return nil, err
+	}
+	operation.CancelRequested = true
+	s.mu.Lock()
+	op := s.running[id]
+	s.mu.Unlock()
+	if op != nil {
+		op.stop()
+	}
+	return operation, nil
+}
+
+// CancelResource cancels the user's active operations working on a resource,
+// for subsystems that keep their own cancel endpoints
+func (s *OperationService) CancelResource(userID, resourceID uuid.UUID) {
+	var ids []uuid.UUID
+	s.db.Model(&model.Operation{}).
+		Where("user_id = ? AND resource_id = ? AND status IN ? AND cancellable", userID, resourceID,
+			[]model.OperationStatus{model.OperationPending, model.OperationRunning}).
+		Pluck("id", &ids)
+	for _, id := range ids {
+		if _, err := s.Cancel(userID, id); err != nil && !errors.Is(err, ErrOperationDone) {
+			s.logger.Warn("failed to cancel operation", zap.String("operationId", id.String()), zap.Error(err))
+		}
+	}
+}
+
+// Run fails operations interrupted by the loss of their instance and prunes
+// finished ones past the retention setting, until ctx is cancelled
+func (s *OperationService) Run(ctx context.Context) {
+	ticker := time.NewTicker(operationSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		if interrupted, err := s.FailInterrupted(); err != nil {
+			s.logger.Error("failed to fail interrupted operations", zap.Error(err))
+		} else if interrupted > 0 {
+			s.logger.Warn("failed interrupted operations", zap.Int64("operations", interrupted))
+		}
+		if deleted, err := s.Prune(); err != nil {
+			s.logger.Error("failed to prune operations", zap.Error(err))
+		} else if deleted > 0 {
+			s.logger.Info("pruned operations", zap.Int64("deleted", deleted))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// FailInterrupted fails the operations whose instance stopped heartbeating,
+// returning the number failed
+func (s *OperationService) FailInterrupted() (int64, error) {
+	result := s.db.Model(&model.Operation{}).
+		Where("status IN ? AND heartbeat_at < ?", []model.OperationStatus{model.OperationPending, model.OperationRunning},
+			time.Now().Add(-operationStaleAfter)).
+		Updates(map[string]interface{}{
+			"status":       model.OperationFailed,
+			"error":        "operation interrupted: the instance running it stopped",
+			"completed_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// Prune deletes finished operations older than the retention setting, returning
+// the number deleted
+func (s *OperationService) Prune() (int64, error) {
+	retention := s.settings.Duration(model.SettingOperationRetention)
+	if retention <= 0 {
+		return 0, nil
+	}
+	result := s.db.Where("status IN ? AND completed_at < ?",
+		[]model.OperationStatus{model.OperationSucceeded, model.OperationFailed, model.OperationCancelled},
+		time.Now().Add(-retention)).Delete(&model.Operation{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,490 @@
+// Package service provides business logic for OpenTelemetry collector deployment
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// Collector deployment defaults
+const (
+	DefaultCollectorVersion = "0.98.0"
+	defaultCollectorImage   = "otel/opentelemetry-collector-contrib"
+	// otelAgentTimeout bounds systemd collector commands, which validate and restart the unit
+	otelAgentTimeout = 60 * time.Second
+)
+
+// ErrCollectorTargetUnavailable is returned when the collector's cluster or host cannot be reached
+var ErrCollectorTargetUnavailable = errors.New("collector target unavailable")
+
+// pipelineTypes are the signal types a pipeline ID may start with
+var pipelineTypes = map[string]bool{"metrics": true, "logs": true, "traces": true}
+
+// OtelCollectorService renders collector configs and deploys them to clusters or hosts
+type OtelCollectorService struct {
+	db       *gorm.DB
+	commands *AgentCommandService
+	logger   *zap.Logger
+}
+
+// NewOtelCollectorService creates a new collector deployment service
+func NewOtelCollectorService(db *gorm.DB, logger *zap.Logger) *OtelCollectorService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &OtelCollectorService{
+		db:       db,
+		commands: NewAgentCommandService(db),
+		logger:   logger,
+	}
+}
+
+// RenderCollectorConfig renders a pipeline spec as collector YAML. The health_check
+// extension is always enabled because deployments probe it.
+func RenderCollectorConfig(spec *model.PipelineSpec) (string, error) {
+	if len(spec.Pipelines) == 0 {
+		return "", fmt.Errorf("at least one pipeline is required")
+	}
+
+	extensions := make(map[string]map[string]interface{}, len(spec.Extensions)+1)
+	for id, cfg := range spec.Extensions {
+		extensions[id] = cfg
+	}
+	if _, ok := extensions["health_check"]; !ok {
+		extensions["health_check"] = map[string]interface{}{
+			"endpoint": fmt.Sprintf("0.0.0.0:%d", k8s.CollectorHealthPort),
+		}
+	}
+
+	pipelines := make(map[string]interface{}, len(spec.Pipelines))
+	for id, p := range spec.Pipelines {
+		signal := strings.SplitN(id, "/", 2)[0]
+		if !pipelineTypes[signal] {
+			return "", fmt.Errorf("pipeline %q: type must be metrics, logs or traces", id)
+		}
+		if len(p.Receivers) == 0 || len(p.Exporters) == 0 {
+			return "", fmt.Errorf("pipeline %q: at least one receiver and one exporter are required", id)
+		}
+		if err := checkComponentRefs(id, "receiver", p.Receivers, spec.Receivers); err != nil {
+			return "", err
+		}
+		if err := checkComponentRefs(id, "processor", p.Processors, spec.Processors); err != nil {
+			return "", err
+		}
+		if err := checkComponentRefs(id, "exporter", p.Exporters, spec.Exporters); err != nil {
+			return "", err
+		}
+
+		pipeline := map[string]interface{}{
+			"receivers": p.Receivers,
+			"exporters": p.Exporters,
+		}
+		if len(p.Processors) > 0 {
+			pipeline["processors"] = p.Processors
+		}
+		pipelines[id] = pipeline
+	}
+
+	extensionIDs := make([]string, 0, len(extensions))
+	for id := range extensions {
+		extensionIDs = append(extensionIDs, id)
+	}
+	sort.Strings(extensionIDs)
+
+	config := map[string]interface{}{
+		"receivers":  componentMap(spec.Receivers),
+		"exporters":  componentMap(spec.Exporters),
+		"extensions": componentMap(extensions),
+		"service": map[string]interface{}{
+			"extensions": extensionIDs,
+			"pipelines":  pipelines,
+		},
+	}
+	if len(spec.Processors) > 0 {
+		config["processors"] = componentMap(spec.Processors)
+	}
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to render config: %w", err)
+	}
+	return string(data), nil
+}
+
+// checkComponentRefs verifies that a pipeline only references defined components
+func checkComponentRefs(pipeline, kind string, refs []string, defined map[string]map[string]interface{}) error {
+	for _, ref := range refs {
+		if _, ok := defined[ref]; !ok {
+			return fmt.Errorf("pipeline %q references undefined %s %q", pipeline, kind, ref)
+		}
+	}
+	return nil
+}
+
+// componentMap keeps components without settings as empty YAML mappings instead of null
+func componentMap(components map[string]map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(components))
+	for id, cfg := range components {
+		if cfg == nil {
+			cfg = map[string]interface{}{}
+		}
+		result[id] = cfg
+	}
+	return result
+}
+
+// CollectorConfig returns the validated YAML config of a collector, rendering its
+// pipeline spec when set. Validation failures are returned as *ConfigValidationError.
+func CollectorConfig(collector *model.OtelCollector) (string, error) {
+	config := collector.Config
+	if collector.Pipeline != "" {
+		var spec model.PipelineSpec
+		if err := json.Unmarshal([]byte(collector.Pipeline), &spec); err != nil {
+			return "", fmt.Errorf("invalid pipeline spec: %w", err)
+		}
+		rendered, err := RenderCollectorConfig(&spec)
+		if err != nil {
+			return "", err
+		}
+		config = rendered
+	}
+	if strings.TrimSpace(config) == "" {
+		return "", fmt.Errorf("collector has no config or pipeline")
+	}
+
+	if result := ValidateCollectorConfig(config); !result.Valid {
+		return "", &ConfigValidationError{Result: result}
+	}
+	return config, nil
+}
+
+// ConfigHash returns the hash used to detect config changes
+func ConfigHash(config string) string {
+	sum := sha256.Sum256([]byte(config))
+	return hex.EncodeToString(sum[:])
+}
+
+// CollectorImage returns the container image of a collector
+func CollectorImage(collector *model.OtelCollector) string {
+	if collector.Image != "" {
+		return collector.Image
+	}
+	version := collector.Version
+	if version == "" {
+		version = DefaultCollectorVersion
+	}
+	return defaultCollectorImage + ":" + version
+}
+
+// Deploy renders the collector config and applies it to the collector's cluster or host.
+// Unchanged configs are re-applied without restarting the collector.
+func (s *OtelCollectorService) Deploy(ctx context.Context, collector *model.OtelCollector, userID *uuid.UUID) error {
+	config, err := CollectorConfig(collector)
+	if err != nil {
+		return err
+	}
+	hash := ConfigHash(config)
+
+	s.setStatus(collector, model.CollectorStatusDeploying, "")
+
+	switch collector.Mode {
+	case model.CollectorModeSystemd:
+		host, err := s.agentHost(collector)
+		if err != nil {
+			return s.fail(collector, err)
+		}
+		args := map[string]interface{}{
+			"name":       collector.Name,
+			"config":     config,
+			"configHash": hash,
+			"healthPort": k8s.CollectorHealthPort,
+		}
+		if _, err := s.runOnAgent(ctx, host, userID, model.AgentCommandOtelApply, args); err != nil {
+			return s.fail(collector, err)
+		}
+	default:
+		client, err := s.clusterClient(collector)
+		if err != nil {
+			return s.fail(collector, err)
+		}
+		defer client.Close()
+
+		spec := &k8s.CollectorSpec{
+			Name:       collector.Name,
+			Namespace:  collector.Namespace,
+			DaemonSet:  collector.Mode == model.CollectorModeDaemonSet,
+			Image:      CollectorImage(collector),
+			Replicas:   collector.Replicas,
+			Config:     config,
+			ConfigHash: hash,
+			Resources:  collector.Resources,
+		}
+		if err := client.ApplyCollector(ctx, spec); err != nil {
+			return s.fail(collector, err)
+		}
+	}
+
+	collector.ConfigHash = hash
+	if err := s.db.Model(collector).Updates(map[string]interface{}{
+		"config_hash":   hash,
+		"error_message": "",
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update collector: %w", err)
+	}
+	return nil
+}
+
+// Stop stops the collector, keeping its config in place for a later start
+func (s *OtelCollectorService) Stop(ctx context.Context, collector *model.OtelCollector, userID *uuid.UUID) error {
+	if err := s.remove(ctx, collector, userID, false); err != nil {
+		return err
+	}
+	s.setStatus(collector, model.CollectorStatusStopped, "")
+	return nil
+}
+
+// Remove deletes everything the collector deployed
+func (s *OtelCollectorService) Remove(ctx context.Context, collector *model.OtelCollector, userID *uuid.UUID) error {
+	return s.remove(ctx, collector, userID, true)
+}
+
+func (s *OtelCollectorService) remove(ctx context.Context, collector *model.OtelCollector, userID *uuid.UUID, purge bool) error {
+	if collector.Mode == model.CollectorModeSystemd {
+		host, err := s.agentHost(collector)
+		if err != nil {
+			return err
+		}
+		_, err = s.runOnAgent(ctx, host, userID, model.AgentCommandOtelRemove, map[string]interface{}{
+			"name":  collector.Name,
+			"purge": purge,
+		})
+		return err
+	}
+
+	client, err := s.clusterClient(collector)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	daemonSet := collector.Mode == model.CollectorModeDaemonSet
+	if purge {
+		return client.DeleteCollector(ctx, collector.Namespace, collector.Name, daemonSet)
+	}
+	return client.StopCollector(ctx, collector.Namespace, collector.Name, daemonSet)
+}
+
+// Restart restarts the collector processes without changing their config
+func (s *OtelCollectorService) Restart(ctx context.Context, collector *model.OtelCollector, userID *uuid.UUID) error {
+	if collector.Mode == model.CollectorModeSystemd {
+		// Re-applying with restart forces the unit to restart after validating the config
+		config, err := CollectorConfig(collector)
+		if err != nil {
+			return err
+		}
+		host, err := s.agentHost(collector)
+		if err != nil {
+			return err
+		}
+		_, err = s.runOnAgent(ctx, host, userID, model.AgentCommandOtelApply, map[string]interface{}{
+			"name":       collector.Name,
+			"config":     config,
+			"configHash": ConfigHash(config),
+			"healthPort": k8s.CollectorHealthPort,
+			"restart":    true,
+		})
+		return err
+	}
+
+	client, err := s.clusterClient(collector)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.RestartCollector(ctx, collector.Namespace, collector.Name, collector.Mode == model.CollectorModeDaemonSet); err != nil {
+		return err
+	}
+	s.setStatus(collector, model.CollectorStatusDeploying, "")
+	return nil
+}
+
+// CheckHealth reads the live state of the collector and records it on the collector
+func (s *OtelCollectorService) CheckHealth(ctx context.Context, collector *model.OtelCollector, userID *uuid.UUID) (*model.CollectorDeploymentStatus, error) {
+	now := time.Now()
+	status := &model.CollectorDeploymentStatus{
+		Status:    collector.Status,
+		PodNames:  []string{},
+		Replicas:  collector.Replicas,
+		Mode:      collector.Mode,
+		CheckedAt: &now,
+	}
+
+	if collector.Mode == model.CollectorModeSystemd {
+		host, err := s.agentHost(collector)
+		if err != nil {
+			return nil, err
+		}
+		output, err := s.runOnAgent(ctx, host, userID, model.AgentCommandOtelStatus, map[string]interface{}{
+			"name":       collector.Name,
+			"healthPort": k8s.CollectorHealthPort,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var unit struct {
+			ActiveState string `json:"activeState"`
+			Healthy     bool   `json:"healthy"`
+			ConfigHash  string `json:"configHash"`
+			MainPID     int32  `json:"mainPid"`
+			Error       string `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(output), &unit); err != nil {
+			return nil, fmt.Errorf("invalid status from agent: %w", err)
+		}
+		status.Replicas = 1
+		status.Healthy = unit.Healthy
+		status.ConfigHash = unit.ConfigHash
+		status.ErrorMessage = unit.Error
+		if unit.ActiveState == "active" && unit.Healthy {
+			status.ReadyReplicas = 1
+		}
+		switch {
+		case unit.ActiveState == "active" && unit.Healthy:
+			status.Status = model.CollectorStatusRunning
+		case unit.ActiveState == "failed":
+			status.Status = model.CollectorStatusError
+		case unit.ActiveState == "inactive" || unit.ActiveState == "":
+			if collector.Status != model.CollectorStatusPending {
+				status.Status = model.CollectorStatusStopped
+			}
+		default:
+			status.Status = model.CollectorStatusDeploying
+		}
+	} else {
+		client, err := s.clusterClient(collector)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		workload, err := client.GetCollectorStatus(ctx, collector.Namespace, collector.Name, collector.Mode == model.CollectorModeDaemonSet)
+		if err != nil {
+			return nil, err
+		}
+		status.PodNames = workload.PodNames
+		status.Replicas = workload.Desired
+		status.ReadyReplicas = workload.Ready
+		status.ConfigHash = workload.ConfigHash
+		status.ErrorMessage = workload.FailureReason
+		status.Healthy = workload.Exists && workload.Desired > 0 && workload.Ready == workload.Desired && !workload.Failed
+		status.MetricsURL = fmt.Sprintf("http://%s.%s.svc:8888/metrics", collector.Name, collector.Namespace)
+		switch {
+		case !workload.Exists:
+			if collector.Status != model.CollectorStatusPending {
+				status.Status = model.CollectorStatusStopped
+			}
+		case workload.Failed:
+			status.Status = model.CollectorStatusError
+		case status.Healthy && workload.Updated == workload.Desired:
+			status.Status = model.CollectorStatusRunning
+		default:
+			status.Status = model.CollectorStatusDeploying
+		}
+	}
+	status.ConfigCurrent = status.ConfigHash != "" && status.ConfigHash == collector.ConfigHash
+
+	podNames, _ := json.Marshal(status.PodNames)
+	collector.Status = status.Status
+	collector.LastHealthCheck = &now
+	collector.ErrorMessage = status.ErrorMessage
+	if err := s.db.Model(collector).Updates(map[string]interface{}{
+		"status":            status.Status,
+		"pod_names":         string(podNames),
+		"last_health_check": now,
+		"error_message":     status.ErrorMessage,
+	}).Error; err != nil {
+		s.logger.Warn("failed to record collector health", zap.String("collector_id", collector.ID.String()), zap.Error(err))
+	}
+
+	return status, nil
+}
+
+// setStatus records a status change, logging rather than failing on database errors
+func (s *OtelCollectorService) setStatus(collector *model.OtelCollector, status model.CollectorStatus, message string) {
+	collector.Status = status
+	collector.ErrorMessage = message
+	if err := s.db.Model(collector).Updates(map[string]interface{}{
+		"status":        status,
+		"error_message": message,
+	}).Error; err != nil {
+		s.logger.Warn("failed to update collector status", zap.String("collector_id", collector.ID.String()), zap.Error(err))
+	}
+}
+
+// fail marks the collector as failed and returns err
+func (s *OtelCollectorService) fail(collector *model.OtelCollector, err error) error {
+	s.setStatus(collector, model.CollectorStatusError, err.Error())
+	return err
+}
+
+func (s *OtelCollectorService) clusterClient(collector *model.OtelCollector) (*k8s.ClusterClient, error) {
+	if collector.ClusterID == nil {
+		return nil, fmt.Errorf("%w: collector has no cluster", ErrCollectorTargetUnavailable)
+	}
+	var cluster model.K8sCluster
+	if err := s.db.First(&cluster, "id = ?", *collector.ClusterID).Error; err != nil {
+		return nil, fmt.Errorf("%w: cluster not found", ErrCollectorTargetUnavailable)
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCollectorTargetUnavailable, err)
+	}
+	return client, nil
+}
+
+func (s *OtelCollectorService) agentHost(collector *model.OtelCollector) (*model.Host, error) {
+	if collector.HostID == nil {
+		return nil, fmt.Errorf("%w: collector has no host", ErrCollectorTargetUnavailable)
+	}
+	var host model.Host
+	if err := s.db.First(&host, "id = ?", *collector.HostID).Error; err != nil {
+		return nil, fmt.Errorf("%w: host not found", ErrCollectorTargetUnavailable)
+	}
+	if !AgentAvailable(&host) {
+		return nil, fmt.Errorf("%w: agent on host %s is offline", ErrCollectorTargetUnavailable, host.Hostname)
+	}
+	return &host, nil
+}
+
+// runOnAgent dispatches a collector command and returns its output
+func (s *OtelCollectorService) runOnAgent(ctx context.Context, host *model.Host, userID *uuid.UUID, cmdType model.AgentCommandType, args interface{}) (string, error) {
+	cmd, err := s.commands.Dispatch(ctx, host.ID, userID, cmdType, args, otelAgentTimeout)
+	if err != nil {
+		return "", err
+	}
+	if cmd.Status != model.AgentCommandStatusCompleted {
+		if cmd.ErrorMessage != "" {
+			return cmd.Output, fmt.Errorf("%s", cmd.ErrorMessage)
+		}
+		return cmd.Output, fmt.Errorf("command %s", cmd.Status)
+	}
+	return cmd.Output, nil
+}
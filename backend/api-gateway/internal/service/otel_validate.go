@@ -0,0 +1,539 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wangjialin/myops/pkg/model"
+	"gopkg.in/yaml.v3"
+)
+
+// componentSchema describes a collector component the platform knows how to validate
+type componentSchema struct {
+	signals []string // pipeline types the component supports; empty means all
+	fields  []string // allowed top-level settings; empty means settings are not checked
+}
+
+// Component kinds, as they appear at the top level of a collector config
+const (
+	kindReceivers  = "receivers"
+	kindProcessors = "processors"
+	kindExporters  = "exporters"
+	kindExtensions = "extensions"
+	kindConnectors = "connectors"
+)
+
+var (
+	metricsOnly = []string{"metrics"}
+	logsOnly    = []string{"logs"}
+	tracesOnly  = []string{"traces"}
+)
+
+// supportedComponents lists the components shipped by the collector distribution
+// deployed by the platform, keyed by kind and component type
+var supportedComponents = map[string]map[string]componentSchema{
+	kindReceivers: {
+		"otlp":              {fields: []string{"protocols"}},
+		"prometheus":        {signals: metricsOnly},
+		"prometheus_simple": {signals: metricsOnly},
+		"hostmetrics":       {signals: metricsOnly},
+		"kubeletstats":      {signals: metricsOnly},
+		"k8s_cluster":       {signals: []string{"metrics", "logs"}},
+		"k8s_events":        {signals: logsOnly},
+		"k8sobjects":        {signals: logsOnly},
+		"filelog":           {signals: logsOnly},
+		"journald":          {signals: logsOnly},
+		"syslog":            {signals: logsOnly},
+		"fluentforward":     {signals: logsOnly},
+		"jaeger":            {signals: tracesOnly},
+		"zipkin":            {signals: tracesOnly},
+		"opencensus":        {signals: []string{"metrics", "traces"}},
+		"statsd":            {signals: metricsOnly},
+		"docker_stats":      {signals: metricsOnly},
+		"httpcheck":         {signals: metricsOnly},
+		"postgresql":        {signals: metricsOnly},
+		"mysql":             {signals: metricsOnly},
+		"redis":             {signals: metricsOnly},
+		"nginx":             {signals: metricsOnly},
+		"receiver_creator":  {},
+	},
+	kindProcessors: {
+		"batch":                 {fields: []string{"timeout", "send_batch_size", "send_batch_max_size", "metadata_keys", "metadata_cardinality_limit"}},
+		"memory_limiter":        {fields: []string{"check_interval", "limit_mib", "spike_limit_mib", "limit_percentage", "spike_limit_percentage"}},
+		"attributes":            {},
+		"resource":              {},
+		"resourcedetection":     {},
+		"k8sattributes":         {},
+		"filter":                {},
+		"transform":             {},
+		"redaction":             {},
+		"groupbyattrs":          {},
+		"probabilistic_sampler": {signals: []string{"traces", "logs"}},
+		"tail_sampling":         {signals: tracesOnly},
+		"span":                  {signals: tracesOnly},
+		"metricstransform":      {signals: metricsOnly},
+		"cumulativetodelta":     {signals: metricsOnly},
+	},
+	kindExporters: {
+		"otlp":                  {},
+		"otlphttp":              {},
+		"debug":                 {fields: []string{"verbosity", "sampling_initial", "sampling_thereafter", "use_internal_logger"}},
+		"logging":               {},
+		"file":                  {},
+		"kafka":                 {},
+		"elasticsearch":         {signals: []string{"logs", "traces"}},
+		"clickhouse":            {},
+		"prometheus":            {signals: metricsOnly},
+		"prometheusremotewrite": {signals: metricsOnly},
+		"loki":                  {signals: logsOnly},
+		"zipkin":                {signals: tracesOnly},
+	},
+	kindExtensions: {
+		"health_check":    {fields: []string{"endpoint", "path", "check_collector_pipeline", "tls", "cors", "auth", "response_headers", "max_request_body_size", "include_metadata"}},
+		"pprof":           {},
+		"zpages":          {},
+		"basicauth":       {},
+		"bearertokenauth": {},
+		"oauth2client":    {},
+		"file_storage":    {},
+		"k8s_observer":    {},
+		"host_observer":   {},
+		"memory_ballast":  {},
+		"headers_setter":  {},
+	},
+	kindConnectors: {
+		"forward":      {},
+		"count":        {},
+		"routing":      {},
+		"spanmetrics":  {},
+		"servicegraph": {},
+	},
+}
+
+// componentKinds is the order component sections are validated in
+var componentKinds = []string{kindReceivers, kindProcessors, kindExporters, kindExtensions, kindConnectors}
+
+// componentTypePattern matches the type part of a component ID
+var componentTypePattern = regexp.MustCompile(`^[a-zA-Z][0-9a-zA-Z_]*$`)
+
+// yamlLinePattern extracts the line from yaml parser errors
+var yamlLinePattern = regexp.MustCompile(`line (\d+): (.*)`)
+
+// ConfigValidationError is returned when a collector config fails validation
+type ConfigValidationError struct {
+	Result *model.ConfigValidationResult
+}
+
+func (e *ConfigValidationError) Error() string {
+	if len(e.Result.Errors) == 0 {
+		return "invalid collector config"
+	}
+	first := e.Result.Errors[0]
+	msg := "invalid collector config: " + first.Message
+	if first.Line > 0 {
+		msg = fmt.Sprintf("invalid collector config: line %d, column %d: %s", first.Line, first.Column, first.Message)
+	}
+	if more := len(e.Result.Errors) - 1; more > 0 {
+		msg += fmt.Sprintf(" (and %d more)", more)
+	}
+	return msg
+}
+
+// configValidator accumulates issues while walking a collector config
+type configValidator struct {
+	result  *model.ConfigValidationResult
+	defined map[string]map[string]*yaml.Node // kind -> component ID -> key node
+	used    map[string]map[string]bool
+	// connectors must feed one pipeline and be fed by another
+	connectorAsReceiver map[string]bool
+	connectorAsExporter map[string]bool
+}
+
+// ValidateCollectorConfig checks collector YAML the way `otelcol validate` does:
+// known top-level sections, supported component types, component settings, and
+// pipelines that only reference defined components of a matching signal type.
+// Components defined but never used are reported as warnings.
+func ValidateCollectorConfig(config string) *model.ConfigValidationResult {
+	v := &configValidator{
+		result: &model.ConfigValidationResult{
+			Errors:   []model.ConfigIssue{},
+			Warnings: []model.ConfigIssue{},
+		},
+		defined:             map[string]map[string]*yaml.Node{},
+		used:                map[string]map[string]bool{},
+		connectorAsReceiver: map[string]bool{},
+		connectorAsExporter: map[string]bool{},
+	}
+	v.validate(config)
+
+	sortIssues(v.result.Errors)
+	sortIssues(v.result.Warnings)
+	v.result.Valid = len(v.result.Errors) == 0
+	if v.result.Valid {
+		v.result.ConfigHash = ConfigHash(config)
+	}
+	return v.result
+}
+
+// DryRunCollectorConfig validates raw collector YAML, or the config rendered from
+// spec when spec is set, without deploying anything
+func DryRunCollectorConfig(config string, spec *model.PipelineSpec) *model.ConfigValidationResult {
+	if spec != nil {
+		rendered, err := RenderCollectorConfig(spec)
+		if err != nil {
+			return &model.ConfigValidationResult{
+				Errors:   []model.ConfigIssue{{Severity: model.ConfigIssueError, Path: "pipeline", Message: err.Error()}},
+				Warnings: []model.ConfigIssue{},
+			}
+		}
+		result := ValidateCollectorConfig(rendered)
+		result.Config = rendered
+		return result
+	}
+	return ValidateCollectorConfig(config)
+}
+
+// DryRunCollector validates the config a collector would be deployed with
+func DryRunCollector(collector *model.OtelCollector) *model.ConfigValidationResult {
+	if collector.Pipeline == "" {
+		return DryRunCollectorConfig(collector.Config, nil)
+	}
+	var spec model.PipelineSpec
+	if err := json.Unmarshal([]byte(collector.Pipeline), &spec); err != nil {
+		return &model.ConfigValidationResult{
+			Errors:   []model.ConfigIssue{{Severity: model.ConfigIssueError, Path: "pipeline", Message: "invalid pipeline spec: " + err.Error()}},
+			Warnings: []model.ConfigIssue{},
+		}
+	}
+	return DryRunCollectorConfig("", &spec)
+}
+
+func (v *configValidator) validate(config string) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(config), &doc); err != nil {
+		v.syntaxError(err)
+		return
+	}
+	if len(doc.Content) == 0 {
+		v.errorf(nil, "", "config is empty")
+		return
+	}
+	root := resolveAlias(doc.Content[0])
+	if root.Kind != yaml.MappingNode {
+		v.errorf(root, "", "config must be a mapping")
+		return
+	}
+
+	sections := v.mapping(root, "", func(key string) bool {
+		return key == "service" || supportedComponents[key] != nil
+	}, "unknown top-level section %q")
+
+	for _, kind := range componentKinds {
+		v.components(kind, sections[kind])
+	}
+
+	service := sections["service"]
+	if service == nil {
+		v.errorf(root, "service", "service section is required")
+		return
+	}
+	v.service(service)
+	v.unused()
+}
+
+// syntaxError records a YAML parse error, keeping the line number when the parser reports one
+func (v *configValidator) syntaxError(err error) {
+	issue := model.ConfigIssue{Severity: model.ConfigIssueError, Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+	if m := yamlLinePattern.FindStringSubmatch(err.Error()); m != nil {
+		issue.Line, _ = strconv.Atoi(m[1])
+		issue.Message = m[2]
+	}
+	v.result.Errors = append(v.result.Errors, issue)
+}
+
+// components validates one component section such as receivers
+func (v *configValidator) components(kind string, node *yaml.Node) {
+	v.defined[kind] = map[string]*yaml.Node{}
+	v.used[kind] = map[string]bool{}
+	if node == nil || isNull(node) {
+		return
+	}
+	if node.Kind != yaml.MappingNode {
+		v.errorf(node, kind, "%s must be a mapping", kind)
+		return
+	}
+
+	singular := strings.TrimSuffix(kind, "s")
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], resolveAlias(node.Content[i+1])
+		id := key.Value
+		path := kind + "." + id
+		if _, dup := v.defined[kind][id]; dup {
+			v.errorf(key, path, "%s %q is defined more than once", singular, id)
+			continue
+		}
+		v.defined[kind][id] = key
+
+		componentType, ok := parseComponentID(id)
+		if !ok {
+			v.errorf(key, path, "invalid %s ID %q: expected type or type/name", singular, id)
+			continue
+		}
+		schema, ok := supportedComponents[kind][componentType]
+		if !ok {
+			v.errorf(key, path, "unknown %s type %q", singular, componentType)
+			continue
+		}
+
+		if isNull(value) {
+			continue
+		}
+		if value.Kind != yaml.MappingNode {
+			v.errorf(value, path, "%s %q settings must be a mapping", singular, id)
+			continue
+		}
+		if len(schema.fields) > 0 {
+			v.mapping(value, path, func(field string) bool {
+				return containsString(schema.fields, field)
+			}, singular+" "+strconv.Quote(id)+" has invalid key %q")
+		}
+	}
+}
+
+// service validates the service section and its pipelines
+func (v *configValidator) service(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		v.errorf(node, "service", "service must be a mapping")
+		return
+	}
+	sections := v.mapping(node, "service", func(key string) bool {
+		return key == "extensions" || key == "pipelines" || key == "telemetry"
+	}, "unknown service key %q")
+
+	if extensions := sections["extensions"]; extensions != nil {
+		for i, ref := range v.refs(extensions, "service.extensions") {
+			path := fmt.Sprintf("service.extensions[%d]", i)
+			if _, ok := v.defined[kindExtensions][ref.Value]; !ok {
+				v.errorf(ref, path, "service references undefined extension %q", ref.Value)
+				continue
+			}
+			v.used[kindExtensions][ref.Value] = true
+		}
+	}
+
+	pipelines := sections["pipelines"]
+	if pipelines == nil || isNull(pipelines) {
+		v.errorf(node, "service.pipelines", "service must have at least one pipeline")
+		return
+	}
+	if pipelines.Kind != yaml.MappingNode {
+		v.errorf(pipelines, "service.pipelines", "service.pipelines must be a mapping")
+		return
+	}
+	if len(pipelines.Content) == 0 {
+		v.errorf(pipelines, "service.pipelines", "service must have at least one pipeline")
+		return
+	}
+	for i := 0; i+1 < len(pipelines.Content); i += 2 {
+		v.pipeline(pipelines.Content[i], resolveAlias(pipelines.Content[i+1]))
+	}
+
+	for id, key := range v.defined[kindConnectors] {
+		asReceiver, asExporter := v.connectorAsReceiver[id], v.connectorAsExporter[id]
+		switch {
+		case asExporter && !asReceiver:
+			v.errorf(key, "connectors."+id, "connector %q is used as an exporter but not as a receiver in any pipeline", id)
+		case asReceiver && !asExporter:
+			v.errorf(key, "connectors."+id, "connector %q is used as a receiver but not as an exporter in any pipeline", id)
+		}
+	}
+}
+
+// pipeline validates one pipeline and records the components it references
+func (v *configValidator) pipeline(key, node *yaml.Node) {
+	id := key.Value
+	path := "service.pipelines." + id
+	signal := strings.SplitN(id, "/", 2)[0]
+	if !pipelineTypes[signal] {
+		v.errorf(key, path, "pipeline %q: type must be metrics, logs or traces", id)
+		return
+	}
+	if node.Kind != yaml.MappingNode {
+		v.errorf(node, path, "pipeline %q must be a mapping", id)
+		return
+	}
+
+	lists := v.mapping(node, path, func(k string) bool {
+		return k == kindReceivers || k == kindProcessors || k == kindExporters
+	}, "unknown pipeline key %q")
+
+	for _, kind := range []string{kindReceivers, kindProcessors, kindExporters} {
+		list := lists[kind]
+		if list == nil || (list.Kind == yaml.SequenceNode && len(list.Content) == 0) {
+			if kind != kindProcessors {
+				v.errorf(key, path+"."+kind, "pipeline %q must have at least one %s", id, strings.TrimSuffix(kind, "s"))
+			}
+			continue
+		}
+
+		seen := map[string]bool{}
+		for i, ref := range v.refs(list, path+"."+kind) {
+			refPath := fmt.Sprintf("%s.%s[%d]", path, kind, i)
+			if seen[ref.Value] {
+				v.errorf(ref, refPath, "pipeline %q references %s %q more than once", id, strings.TrimSuffix(kind, "s"), ref.Value)
+				continue
+			}
+			seen[ref.Value] = true
+			v.reference(ref, refPath, id, signal, kind)
+		}
+	}
+}
+
+// reference resolves a component referenced from a pipeline and checks its signal support
+func (v *configValidator) reference(ref *yaml.Node, path, pipeline, signal, kind string) {
+	name := ref.Value
+	singular := strings.TrimSuffix(kind, "s")
+
+	if _, ok := v.defined[kind][name]; ok {
+		v.used[kind][name] = true
+		componentType, _ := parseComponentID(name)
+		schema := supportedComponents[kind][componentType]
+		if len(schema.signals) > 0 && !containsString(schema.signals, signal) {
+			v.errorf(ref, path, "%s %q does not support %s pipelines", singular, name, signal)
+		}
+		return
+	}
+
+	// Connectors appear in the receivers and exporters lists of pipelines
+	if kind != kindProcessors {
+		if _, ok := v.defined[kindConnectors][name]; ok {
+			v.used[kindConnectors][name] = true
+			if kind == kindReceivers {
+				v.connectorAsReceiver[name] = true
+			} else {
+				v.connectorAsExporter[name] = true
+			}
+			return
+		}
+	}
+	v.errorf(ref, path, "pipeline %q references undefined %s %q", pipeline, singular, name)
+}
+
+// unused warns about components that are defined but not referenced anywhere
+func (v *configValidator) unused() {
+	for _, kind := range componentKinds {
+		singular := strings.TrimSuffix(kind, "s")
+		for id, key := range v.defined[kind] {
+			if !v.used[kind][id] {
+				v.warnf(key, kind+"."+id, "%s %q is defined but not used", singular, id)
+			}
+		}
+	}
+}
+
+// mapping returns the values of a mapping node by key, reporting duplicate keys
+// and keys rejected by allowed
+func (v *configValidator) mapping(node *yaml.Node, path string, allowed func(string) bool, unknownFormat string) map[string]*yaml.Node {
+	values := map[string]*yaml.Node{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		keyPath := joinPath(path, key.Value)
+		if _, dup := values[key.Value]; dup {
+			v.errorf(key, keyPath, "key %q is defined more than once", key.Value)
+			continue
+		}
+		if !allowed(key.Value) {
+			v.errorf(key, keyPath, unknownFormat, key.Value)
+			continue
+		}
+		values[key.Value] = resolveAlias(node.Content[i+1])
+	}
+	return values
+}
+
+// refs returns the scalar entries of a component ID list
+func (v *configValidator) refs(node *yaml.Node, path string) []*yaml.Node {
+	if node.Kind != yaml.SequenceNode {
+		v.errorf(node, path, "%s must be a list", path)
+		return nil
+	}
+	refs := make([]*yaml.Node, 0, len(node.Content))
+	for i, item := range node.Content {
+		item = resolveAlias(item)
+		if item.Kind != yaml.ScalarNode || item.Value == "" {
+			v.errorf(item, fmt.Sprintf("%s[%d]", path, i), "component IDs must be strings")
+			continue
+		}
+		refs = append(refs, item)
+	}
+	return refs
+}
+
+func (v *configValidator) errorf(node *yaml.Node, path, format string, args ...interface{}) {
+	v.result.Errors = append(v.result.Errors, newIssue(model.ConfigIssueError, node, path, fmt.Sprintf(format, args...)))
+}
+
+func (v *configValidator) warnf(node *yaml.Node, path, format string, args ...interface{}) {
+	v.result.Warnings = append(v.result.Warnings, newIssue(model.ConfigIssueWarning, node, path, fmt.Sprintf(format, args...)))
+}
+
+func newIssue(severity model.ConfigIssueSeverity, node *yaml.Node, path, message string) model.ConfigIssue {
+	issue := model.ConfigIssue{Severity: severity, Path: path, Message: message}
+	if node != nil {
+		issue.Line = node.Line
+		issue.Column = node.Column
+	}
+	return issue
+}
+
+// sortIssues orders issues by their position in the config
+func sortIssues(issues []model.ConfigIssue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Column < issues[j].Column
+	})
+}
+
+// parseComponentID splits a component ID of the form type[/name] and returns its type
+func parseComponentID(id string) (string, bool) {
+	componentType, name, hasName := strings.Cut(id, "/")
+	if !componentTypePattern.MatchString(componentType) || (hasName && name == "") {
+		return "", false
+	}
+	return componentType, true
+}
+
+// resolveAlias follows YAML aliases to the node they refer to
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// isNull reports whether a node is an empty or null scalar
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && (node.Tag == "!!null" || node.Value == "")
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,315 @@
+// Package service provides port-forward sessions to cluster pods
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// portForwardDialTimeout bounds resolving the target and connecting to the pod
+const portForwardDialTimeout = 30 * time.Second
+
+var (
+	// ErrInvalidPortForward is returned for port-forward requests that cannot be opened
+	ErrInvalidPortForward = errors.New("invalid port forward")
+	// ErrPortForwardUnreachable is returned when the target pod port cannot be reached
+	ErrPortForwardUnreachable = errors.New("port forward target unreachable")
+	// ErrPortForwardNotFound is returned when a session does not exist or is not open on this gateway
+	ErrPortForwardNotFound = errors.New("port-forward session not found")
+)
+
+// PortForwardUser identifies who opens a port-forward session
+type PortForwardUser struct {
+	ID        uuid.UUID
+	Username  string
+	IPAddress string
+}
+
+// PortForward is an open port-forward session. Conn is the connection to the pod
+// port; the session is over once Done is closed.
+type PortForward struct {
+	Session *model.PortForwardSession
+	Conn    *k8s.PortForwardConn
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	client     *k8s.ClusterClient
+	terminated atomic.Bool
+	bytesIn    atomic.Int64
+	bytesOut   atomic.Int64
+}
+
+// Done is closed when the session expires or is terminated
+func (pf *PortForward) Done() <-chan struct{} {
+	return pf.ctx.Done()
+}
+
+// CountIn records bytes sent from the client to the pod
+func (pf *PortForward) CountIn(n int) {
+	pf.bytesIn.Add(int64(n))
+}
+
+// CountOut records bytes sent from the pod to the client
+func (pf *PortForward) CountOut(n int) {
+	pf.bytesOut.Add(int64(n))
+}
+
+// PortForwardService opens port-forward sessions to pod and service ports, closes
+// them when their TTL runs out and records each one in the audit log
+type PortForwardService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	settings *SettingsService
+
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*PortForward // Sessions open on this gateway
+}
+
+// NewPortForwardService creates a new port-forward service
+func NewPortForwardService(db *gorm.DB, logger *zap.Logger, settings *SettingsService) *PortForwardService {
+	return &PortForwardService{
+		db:       db,
+		logger:   logger,
+		settings: settings,
+		sessions: make(map[uuid.UUID]*PortForward),
+	}
+}
+
+// Recover closes the sessions left active by a gateway that stopped while they were
+// open, so they no longer count against quotas
+func (s *PortForwardService) Recover() error {
+	return s.db.Model(&model.PortForwardSession{}).
+		Where("status = ?", model.PortForwardActive).
+		Updates(map[string]interface{}{
+			"status":       model.PortForwardClosed,
+			"close_reason": model.PortForwardInterrupted,
+			"closed_at":    time.Now(),
+		}).Error
+}
+
+// Open connects to the requested pod port on cluster and starts a session. Service
+// targets are forwarded to one of the service's ready pods. The caller must Close
+// the session.
+func (s *PortForwardService) Open(ctx context.Context, cluster *model.K8sCluster, req *model.PortForwardRequest, user PortForwardUser) (*PortForward, error) {
+	if req.Namespace == "" {
+		return nil, fmt.Errorf("%w: namespace is required", ErrInvalidPortForward)
+	}
+	if (req.PodName == "") == (req.ServiceName == "") {
+		return nil, fmt.Errorf("%w: exactly one of podName and serviceName is required", ErrInvalidPortForward)
+	}
+	if req.Port < 0 || req.Port > 65535 || (req.Port == 0 && req.PodName != "") {
+		return nil, fmt.Errorf("%w: port must be between 1 and 65535", ErrInvalidPortForward)
+	}
+
+	ttl := s.settings.Duration(model.SettingClusterPortForwardTTL)
+	if req.TTL > 0 && req.TTL < ttl {
+		ttl = req.TTL
+	}
+
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cluster client: %w", err)
+	}
+
+	dialCtx, cancelDial := context.WithTimeout(ctx, portForwardDialTimeout)
+	defer cancelDial()
+
+	target := &k8s.PortForwardTarget{PodName: req.PodName, Port: req.Port}
+	if req.ServiceName != "" {
+		if target, err = client.ResolveServicePort(dialCtx, req.Namespace, req.ServiceName, req.Port); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("%w: %v", ErrPortForwardUnreachable, err)
+		}
+	}
+
+	sessionCtx, cancel := context.WithTimeout(context.Background(), ttl)
+	conn, err := client.DialPodPort(sessionCtx, req.Namespace, target.PodName, target.Port)
+	if err != nil {
+		cancel()
+		client.Close()
+		return nil, fmt.Errorf("%w: %v", ErrPortForwardUnreachable, err)
+	}
+
+	now := time.Now()
+	session := &model.PortForwardSession{
+		ID:          uuid.New(),
+		UserID:      user.ID,
+		Username:    user.Username,
+		ClusterID:   cluster.ID,
+		Namespace:   req.Namespace,
+		PodName:     target.PodName,
+		ServiceName: req.ServiceName,
+		Port:        target.Port,
+		Status:      model.PortForwardActive,
+		IPAddress:   user.IPAddress,
+		ExpiresAt:   now.Add(ttl),
+		CreatedAt:   now,
+	}
+	if err := s.db.Create(session).Error; err != nil {
+		conn.Close()
+		cancel()
+		client.Close()
+		return nil, fmt.Errorf("failed to record port-forward session: %w", err)
+	}
+	s.audit(session, "port_forward_open", http.StatusOK)
+
+	pf := &PortForward{
+		Session: session,
+		Conn:    conn,
+		ctx:     sessionCtx,
+		cancel:  cancel,
+		client:  client,
+	}
+	s.mu.Lock()
+	s.sessions[session.ID] = pf
+	s.mu.Unlock()
+
+	s.logger.Info("port-forward session opened",
+		zap.String("session_id", session.ID.String()),
+		zap.String("user_id", user.ID.String()),
+		zap.String("cluster_id", cluster.ID.String()),
+		zap.String("pod", req.Namespace+"/"+target.PodName),
+		zap.Int32("port", target.Port),
+	)
+	return pf, nil
+}
+
+// Close ends a session for reason, or because it expired or was terminated if it
+// did, and records how it ended. failure is the error that broke the connection.
+func (s *PortForwardService) Close(pf *PortForward, reason string, failure error) {
+	expired := errors.Is(pf.ctx.Err(), context.DeadlineExceeded)
+	pf.cancel()
+	pf.Conn.Close()
+	pf.client.Close()
+
+	s.mu.Lock()
+	delete(s.sessions, pf.Session.ID)
+	s.mu.Unlock()
+
+	switch {
+	case pf.terminated.Load():
+		reason, failure = model.PortForwardTerminated, nil
+	case expired:
+		reason, failure = model.PortForwardExpired, nil
+	}
+	if failure == nil {
+		failure = pf.Conn.Err()
+	}
+
+	now := time.Now()
+	session := pf.Session
+	session.Status = model.PortForwardClosed
+	session.CloseReason = reason
+	session.BytesIn = pf.bytesIn.Load()
+	session.BytesOut = pf.bytesOut.Load()
+	session.ClosedAt = &now
+	status := http.StatusOK
+	if failure != nil {
+		session.Error = failure.Error()
+		status = http.StatusBadGateway
+	}
+
+	if err := s.db.Model(session).Updates(map[string]interface{}{
+		"status":       session.Status,
+		"close_reason": session.CloseReason,
+		"error":        session.Error,
+		"bytes_in":     session.BytesIn,
+		"bytes_out":    session.BytesOut,
+		"closed_at":    session.ClosedAt,
+	}).Error; err != nil {
+		s.logger.Error("failed to record port-forward session end", zap.String("session_id", session.ID.String()), zap.Error(err))
+	}
+	s.audit(session, "port_forward_close", status)
+
+	s.logger.Info("port-forward session closed",
+		zap.String("session_id", session.ID.String()),
+		zap.String("reason", reason),
+		zap.Int64("bytes_in", session.BytesIn),
+		zap.Int64("bytes_out", session.BytesOut),
+	)
+}
+
+// Terminate closes an open session ahead of its expiry
+func (s *PortForwardService) Terminate(id uuid.UUID) error {
+	s.mu.Lock()
+	pf, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok {
+		return ErrPortForwardNotFound
+	}
+	pf.terminated.Store(true)
+	pf.cancel()
+	return nil
+}
+
+// Get returns a session by ID
+func (s *PortForwardService) Get(id uuid.UUID) (*model.PortForwardSession, error) {
+	var session model.PortForwardSession
+	if err := s.db.Where("id = ?", id).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPortForwardNotFound
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// List returns the most recent sessions, of one user unless userID is nil, with the
+// given status unless it is empty
+func (s *PortForwardService) List(userID *uuid.UUID, status model.PortForwardStatus, limit int) ([]model.PortForwardSession, error) {
+	query := s.db.Model(&model.PortForwardSession{})
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var sessions []model.PortForwardSession
+	if err := query.Order("created_at DESC").Limit(limit).Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// audit records the opening or closing of a session in the audit log, with the
+// session's duration once it is closed
+func (s *PortForwardService) audit(session *model.PortForwardSession, action string, status int) {
+	entry := struct {
+		*model.PortForwardSession
+		DurationMs int64 `json:"durationMs,omitempty"`
+	}{PortForwardSession: session}
+	if session.ClosedAt != nil {
+		entry.DurationMs = session.ClosedAt.Sub(session.CreatedAt).Milliseconds()
+	}
+	value, _ := json.Marshal(entry)
+	s.db.Create(&model.AuditLog{
+		ID:         uuid.New(),
+		UserID:     session.UserID,
+		Username:   session.Username,
+		Action:     action,
+		Resource:   string(model.ResourceCluster),
+		ResourceID: session.ClusterID.String(),
+		Method:     "WS",
+		Path:       fmt.Sprintf("/api/v1/clusters/%s/namespaces/%s/pods/%s/portforward/%d", session.ClusterID, session.Namespace, session.PodName, session.Port),
+		IPAddress:  session.IPAddress,
+		StatusCode: status,
+		ErrorMsg:   session.Error,
+		NewValue:   string(value),
+	})
+}
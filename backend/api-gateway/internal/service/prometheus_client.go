@@ -0,0 +1,412 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/logging"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// PrometheusClient queries the Prometheus HTTP API of a data source
+type PrometheusClient struct {
+	baseURL         string
+	flavor          string
+	partialResponse bool
+	headers         map[string]string
+	username        string
+	password        string
+	http            *http.Client
+}
+
+// NewPrometheusClient creates a client for the data source, honouring its TLS and auth
+// settings and the API differences of its flavor
+func NewPrometheusClient(ds *model.PrometheusDataSource) (*PrometheusClient, error) {
+	base, err := url.Parse(strings.TrimRight(ds.URL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid data source URL: %s", ds.URL)
+	}
+	if !model.IsValidDataSourceFlavor(ds.Flavor) {
+		return nil, fmt.Errorf("unsupported data source flavor: %s", ds.Flavor)
+	}
+	if ds.Flavor == model.DSFlavorVirtual {
+		return nil, fmt.Errorf("virtual data sources are queried through their members")
+	}
+	flavor := ds.Flavor
+	if flavor == "" {
+		flavor = model.DSFlavorPrometheus
+	}
+
+	headers := map[string]string{}
+	if ds.Headers != "" {
+		if err := json.Unmarshal([]byte(ds.Headers), &headers); err != nil {
+			return nil, fmt.Errorf("invalid headers: %w", err)
+		}
+	}
+
+	switch flavor {
+	case model.DSFlavorMimir:
+		// Mimir serves the Prometheus API under /prometheus and picks the tenant by header
+		if base.Path == "" {
+			base.Path = "/prometheus"
+		}
+		if ds.TenantID != "" {
+			setDefaultHeader(headers, "X-Scope-OrgID", ds.TenantID)
+		}
+	case model.DSFlavorThanos:
+		if ds.TenantID != "" {
+			setDefaultHeader(headers, "THANOS-TENANT", ds.TenantID)
+		}
+	case model.DSFlavorVictoriaMetrics:
+		// The cluster version serves each account under /select/{accountID}/prometheus
+		if ds.TenantID != "" && !strings.Contains(base.Path, "/select/") {
+			base.Path += "/select/" + url.PathEscape(ds.TenantID) + "/prometheus"
+		}
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: ds.InsecureSkipTLS}
+	if ds.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(ds.CACert)) {
+			return nil, fmt.Errorf("invalid CA certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if ds.ClientCert != "" && ds.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(ds.ClientCert), []byte(ds.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return &PrometheusClient{
+		baseURL:         base.String(),
+		flavor:          flavor,
+		partialResponse: ds.PartialResponse,
+		headers:         headers,
+		username:        ds.Username,
+		password:        ds.Password,
+		http: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}, nil
+}
+
+// setDefaultHeader sets a header unless the data source's own headers already do
+func setDefaultHeader(headers map[string]string, name, value string) {
+	for k := range headers {
+		if http.CanonicalHeaderKey(k) == http.CanonicalHeaderKey(name) {
+			return
+		}
+	}
+	headers[name] = value
+}
+
+// prometheusResponse is the envelope of every Prometheus API response
+type prometheusResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+	Warnings  []string        `json:"warnings"`
+}
+
+// prometheusMatrix is the data of a range query
+type prometheusMatrix struct {
+	ResultType string `json:"resultType"`
+	Result     []struct {
+		Metric     map[string]string         `json:"metric"`
+		Values     [][2]interface{}          `json:"values"`
+		Histograms []prometheusHistogramPair `json:"histograms"` // Native histograms
+	} `json:"result"`
+}
+
+// QueryRange evaluates a PromQL expression over a range and returns the resulting
+// series and the warnings of the backend, such as a Thanos partial response
+func (c *PrometheusClient) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]model.PrometheusSeries, []string, error) {
+	params := c.queryParams(query)
+	params.Set("start", strconv.FormatInt(start.Unix(), 10))
+	params.Set("end", strconv.FormatInt(end.Unix(), 10))
+	params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+
+	var matrix prometheusMatrix
+	warnings, err := c.get(ctx, "/api/v1/query_range", params, &matrix)
+	if err != nil {
+		return nil, nil, err
+	}
+	if matrix.ResultType != "matrix" {
+		return nil, nil, fmt.Errorf("unexpected result type: %s", matrix.ResultType)
+	}
+
+	series := make([]model.PrometheusSeries, 0, len(matrix.Result))
+	for _, r := range matrix.Result {
+		s := model.PrometheusSeries{Metric: r.Metric, Values: make([]model.PrometheusValue, 0, len(r.Values))}
+		for _, v := range r.Values {
+			s.Values = append(s.Values, *samplePair(v))
+		}
+		for _, h := range r.Histograms {
+			histogram, err := h.histogram()
+			if err != nil {
+				return nil, nil, err
+			}
+			s.Histograms = append(s.Histograms, *histogram)
+		}
+		series = append(series, s)
+	}
+	return series, warnings, nil
+}
+
+// queryParams returns the parameters of a query, with the flavor's own options
+func (c *PrometheusClient) queryParams(query string) url.Values {
+	params := url.Values{}
+	params.Set("query", query)
+	if c.flavor == model.DSFlavorThanos {
+		params.Set("partial_response", strconv.FormatBool(c.partialResponse))
+	}
+	return params
+}
+
+// prometheusVector is the data of an instant query
+type prometheusVector struct {
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// Query evaluates a PromQL expression at a single time. Scalar and string results are
+// returned as one series without labels.
+func (c *PrometheusClient) Query(ctx context.Context, query string, at time.Time) ([]model.PrometheusSeries, []string, error) {
+	params := c.queryParams(query)
+	params.Set("time", strconv.FormatInt(at.Unix(), 10))
+
+	var data prometheusVector
+	warnings, err := c.get(ctx, "/api/v1/query", params, &data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch data.ResultType {
+	case "vector":
+		var result []struct {
+			Metric    map[string]string        `json:"metric"`
+			Value     *[2]interface{}          `json:"value"`
+			Histogram *prometheusHistogramPair `json:"histogram"` // Native histograms
+		}
+		if err := json.Unmarshal(data.Result, &result); err != nil {
+			return nil, nil, fmt.Errorf("invalid prometheus response: %w", err)
+		}
+		series := make([]model.PrometheusSeries, 0, len(result))
+		for _, r := range result {
+			s := model.PrometheusSeries{Metric: r.Metric}
+			if r.Value != nil {
+				s.Value = samplePair(*r.Value)
+			}
+			if r.Histogram != nil {
+				if s.Histogram, err = r.Histogram.histogram(); err != nil {
+					return nil, nil, err
+				}
+			}
+			series = append(series, s)
+		}
+		return series, warnings, nil
+	case "scalar", "string":
+		var pair [2]interface{}
+		if err := json.Unmarshal(data.Result, &pair); err != nil {
+			return nil, nil, fmt.Errorf("invalid prometheus response: %w", err)
+		}
+		return []model.PrometheusSeries{{Metric: map[string]string{}, Value: samplePair(pair)}}, warnings, nil
+	case "matrix":
+		return nil, nil, fmt.Errorf("query returns a range vector; run it as a range query instead")
+	}
+	return nil, nil, fmt.Errorf("unexpected result type: %s", data.ResultType)
+}
+
+// LabelValues returns the values of a label among the series matching any of the
+// selectors between start and end, or among every series without selectors
+func (c *PrometheusClient) LabelValues(ctx context.Context, label string, matchers []string, start, end time.Time) ([]string, []string, error) {
+	var values []string
+	warnings, err := c.get(ctx, "/api/v1/label/"+url.PathEscape(label)+"/values", c.seriesParams(matchers, start, end), &values)
+	if err != nil {
+		return nil, nil, err
+	}
+	return values, warnings, nil
+}
+
+// LabelNames returns the label names of the series matching any of the selectors
+// between start and end, or of every series without selectors
+func (c *PrometheusClient) LabelNames(ctx context.Context, matchers []string, start, end time.Time) ([]string, []string, error) {
+	var names []string
+	warnings, err := c.get(ctx, "/api/v1/labels", c.seriesParams(matchers, start, end), &names)
+	if err != nil {
+		return nil, nil, err
+	}
+	return names, warnings, nil
+}
+
+// seriesParams returns the parameters of a metadata query
+func (c *PrometheusClient) seriesParams(matchers []string, start, end time.Time) url.Values {
+	params := url.Values{}
+	for _, m := range matchers {
+		params.Add("match[]", m)
+	}
+	params.Set("start", strconv.FormatInt(start.Unix(), 10))
+	params.Set("end", strconv.FormatInt(end.Unix(), 10))
+	if c.flavor == model.DSFlavorThanos {
+		params.Set("partial_response", strconv.FormatBool(c.partialResponse))
+	}
+	return params
+}
+
+// samplePair converts a [timestamp, "value"] pair from the Prometheus API
+func samplePair(pair [2]interface{}) *model.PrometheusValue {
+	ts, _ := pair[0].(float64)
+	value, _ := pair[1].(string)
+	return &model.PrometheusValue{Timestamp: ts, Value: value}
+}
+
+// prometheusHistogramPair is a [timestamp, histogram] pair of a native histogram,
+// whose buckets are [boundaries, lower, upper, count]
+type prometheusHistogramPair [2]json.RawMessage
+
+func (pair prometheusHistogramPair) histogram() (*model.PrometheusHistogram, error) {
+	var ts float64
+	var h struct {
+		Count   string           `json:"count"`
+		Sum     string           `json:"sum"`
+		Buckets [][4]interface{} `json:"buckets"`
+	}
+	if err := json.Unmarshal(pair[0], &ts); err != nil {
+		return nil, fmt.Errorf("invalid prometheus histogram: %w", err)
+	}
+	if err := json.Unmarshal(pair[1], &h); err != nil {
+		return nil, fmt.Errorf("invalid prometheus histogram: %w", err)
+	}
+
+	histogram := &model.PrometheusHistogram{Timestamp: ts, Count: h.Count, Sum: h.Sum}
+	for _, b := range h.Buckets {
+		boundaries, _ := b[0].(float64)
+		lower, _ := b[1].(string)
+		upper, _ := b[2].(string)
+		count, _ := b[3].(string)
+		histogram.Buckets = append(histogram.Buckets, model.PrometheusHistogramBucket{Boundaries: int(boundaries), Lower: lower, Upper: upper, Count: count})
+	}
+	return histogram, nil
+}
+
+// get calls an API endpoint, decodes the data field of the response into out and
+// returns the warnings of the response
+func (c *PrometheusClient) get(ctx context.Context, path string, query url.Values, out interface{}) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	var envelope prometheusResponse
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("prometheus returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body[:min(len(body), 512)])))
+		}
+		return nil, fmt.Errorf("invalid prometheus response: %w", err)
+	}
+	if envelope.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed (%s): %s", envelope.ErrorType, envelope.Error)
+	}
+	if out == nil {
+		return envelope.Warnings, nil
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return nil, fmt.Errorf("invalid prometheus response: %w", err)
+	}
+	return envelope.Warnings, nil
+}
+
+// PrometheusBuildInfo is the build information a backend reports
+type PrometheusBuildInfo struct {
+	Application string `json:"application"` // Reported by Mimir
+	Version     string `json:"version"`
+	Revision    string `json:"revision"`
+}
+
+// BuildInfo reads /api/v1/status/buildinfo. VictoriaMetrics answers it with the
+// Prometheus version it is compatible with rather than its own, so it is not asked.
+func (c *PrometheusClient) BuildInfo(ctx context.Context) (*PrometheusBuildInfo, error) {
+	if c.flavor == model.DSFlavorVictoriaMetrics {
+		return nil, fmt.Errorf("victoriametrics does not report its build info")
+	}
+	var info PrometheusBuildInfo
+	if _, err := c.get(ctx, "/api/v1/status/buildinfo", url.Values{}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// TestPrometheusConnection checks that a data source answers queries and reports
+// the version of its backend. Backends without build info, such as older Thanos
+// queriers, are tested with a query instead.
+func TestPrometheusConnection(ctx context.Context, ds *model.PrometheusDataSource) *model.TestPrometheusDataSourceResponse {
+	started := time.Now()
+	result := &model.TestPrometheusDataSourceResponse{Flavor: ds.Flavor}
+	if result.Flavor == "" {
+		result.Flavor = model.DSFlavorPrometheus
+	}
+	defer func() { result.Duration = time.Since(started).Milliseconds() }()
+
+	client, err := NewPrometheusClient(ds)
+	if err != nil {
+		result.Message = "Invalid data source configuration"
+		result.Error = err.Error()
+		return result
+	}
+
+	if info, err := client.BuildInfo(ctx); err == nil {
+		result.Success = true
+		result.Version = info.Version
+		result.Application = info.Application
+		result.Message = "Successfully connected to " + result.Flavor
+		return result
+	}
+	if _, _, err := client.Query(ctx, "vector(1)", time.Now()); err != nil {
+		result.Message = "Failed to connect to " + result.Flavor
+		result.Error = err.Error()
+		return result
+	}
+	result.Success = true
+	if result.Flavor == model.DSFlavorVictoriaMetrics {
+		result.Application = "VictoriaMetrics"
+	}
+	result.Message = "Successfully connected to " + result.Flavor + "; build info is not available"
+	return result
+}
@@ -0,0 +1,515 @@
+// Package service provides Prometheus query execution, history and saved queries
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidPrometheusQuery is returned when a query or its time range is malformed
+	ErrInvalidPrometheusQuery = errors.New("invalid prometheus query")
+	// ErrPrometheusQueryFailed is returned when Prometheus rejects or fails a query
+	ErrPrometheusQueryFailed = errors.New("prometheus query failed")
+	// ErrPrometheusDataSourceNotFound is returned when the user has no such data source
+	ErrPrometheusDataSourceNotFound = errors.New("data source not found")
+	// ErrSavedQueryNotFound is returned when the user has no such saved query
+	ErrSavedQueryNotFound = errors.New("saved query not found")
+	// ErrQueryHistoryNotFound is returned when the user has no such history entry
+	ErrQueryHistoryNotFound = errors.New("query history entry not found")
+)
+
+const (
+	// queryTimeout bounds one query against a data source
+	queryTimeout = 30 * time.Second
+	// queryRangePoints is the number of points a range query without a step returns
+	queryRangePoints = 250
+	// maxQueryRangePoints is the most points Prometheus returns for one range query
+	maxQueryRangePoints = 11000
+	// queryHistoryPruneInterval is how often the query history is pruned
+	queryHistoryPruneInterval = time.Hour
+)
+
+// PrometheusQueryService runs PromQL queries against a user's data sources,
+// records them in the query history and manages saved queries
+type PrometheusQueryService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	settings *SettingsService
+}
+
+// NewPrometheusQueryService creates a new Prometheus query service
+func NewPrometheusQueryService(db *gorm.DB, logger *zap.Logger, settings *SettingsService) *PrometheusQueryService {
+	return &PrometheusQueryService{db: db, logger: logger, settings: settings}
+}
+
+// ============== Execution ==============
+
+// Execute runs a query against one of the user's data sources and records it in
+// the history, whether it succeeds or not
+func (s *PrometheusQueryService) Execute(ctx context.Context, userID, dataSourceID uuid.UUID, req *model.PrometheusQueryRequest) (*model.PrometheusQueryResponse, error) {
+	var ds model.PrometheusDataSource
+	if err := s.db.Where("id = ? AND user_id = ?", dataSourceID, userID).First(&ds).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPrometheusDataSourceNotFound
+		}
+		return nil, err
+	}
+	query, err := promQueryExpr(req.Query, req.Builder)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("%w: query is required", ErrInvalidPrometheusQuery)
+	}
+	req.Query = query
+	if req.QueryType == "" {
+		req.QueryType = "instant"
+	}
+	if req.QueryType != "instant" && req.QueryType != "range" {
+		return nil, fmt.Errorf("%w: queryType must be instant or range", ErrInvalidPrometheusQuery)
+	}
+
+	now := time.Now()
+	end, err := parsePromTime(req.EndTime, now)
+	if err != nil {
+		return nil, fmt.Errorf("%w: endTime: %v", ErrInvalidPrometheusQuery, err)
+	}
+	var start time.Time
+	var step time.Duration
+	if req.QueryType == "range" {
+		if start, err = parsePromTime(req.StartTime, end.Add(-time.Hour)); err != nil {
+			return nil, fmt.Errorf("%w: startTime: %v", ErrInvalidPrometheusQuery, err)
+		}
+		if !start.Before(end) {
+			return nil, fmt.Errorf("%w: startTime must be before endTime", ErrInvalidPrometheusQuery)
+		}
+		if step, err = queryStep(req.Step, end.Sub(start)); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := NewDataSourceQuerier(s.db, &ds)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPrometheusQueryFailed, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	started := time.Now()
+	var series []model.PrometheusSeries
+	var warnings []string
+	if req.QueryType == "range" {
+		series, warnings, err = client.QueryRange(ctx, req.Query, start, end, step)
+	} else {
+		series, warnings, err = client.Query(ctx, req.Query, end)
+	}
+	duration := time.Since(started).Milliseconds()
+
+	record := model.PrometheusQuery{
+		UserID:       userID,
+		DataSourceID: dataSourceID,
+		Query:        req.Query,
+		QueryType:    req.QueryType,
+		StartTime:    req.StartTime,
+		EndTime:      req.EndTime,
+		Step:         req.Step,
+		Duration:     duration,
+		Success:      err == nil,
+		ResultCount:  len(series),
+	}
+	if err != nil {
+		record.ErrorMessage = err.Error()
+	}
+	if dbErr := s.db.Create(&record).Error; dbErr != nil {
+		s.logger.Warn("failed to record prometheus query", zap.Error(dbErr))
+	}
+	s.db.Model(&ds).Updates(map[string]interface{}{
+		"query_count":     gorm.Expr("query_count + 1"),
+		"last_queried_at": time.Now(),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPrometheusQueryFailed, err)
+	}
+	return &model.PrometheusQueryResponse{Status: "success", Data: series, Warnings: warnings, Duration: duration}, nil
+}
+
+// PreviewAlertRule evaluates an alerting expression now against one of the
+// user's data sources, virtual ones included, without recording it in the history
+func (s *PrometheusQueryService) PreviewAlertRule(ctx context.Context, userID uuid.UUID, req *model.PrometheusAlertRulePreviewRequest) (*model.PrometheusAlertRulePreview, error) {
+	if strings.TrimSpace(req.Expression) == "" {
+		return nil, fmt.Errorf("%w: expression is required", ErrInvalidPrometheusQuery)
+	}
+	var ds model.PrometheusDataSource
+	if err := s.db.Where("id = ? AND user_id = ?", req.DataSourceID, userID).First(&ds).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPrometheusDataSourceNotFound
+		}
+		return nil, err
+	}
+
+	client, err := NewDataSourceQuerier(s.db, &ds)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPrometheusQueryFailed, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	started := time.Now()
+	series, warnings, err := client.Query(ctx, req.Expression, started)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPrometheusQueryFailed, err)
+	}
+	return &model.PrometheusAlertRulePreview{Series: series, Warnings: warnings, Duration: time.Since(started).Milliseconds()}, nil
+}
+
+// parsePromTime parses an RFC 3339 time, unix seconds, "now", or a time relative
+// to now such as "now-1h" or "1h ago". An empty string is fallback.
+func parsePromTime(s string, fallback time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	now := time.Now()
+	switch {
+	case s == "":
+		return fallback, nil
+	case s == "now":
+		return now, nil
+	case strings.HasPrefix(s, "now-"):
+		d, err := time.ParseDuration(strings.TrimPrefix(s, "now-"))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-d), nil
+	case strings.HasSuffix(s, " ago"):
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimSuffix(s, " ago")))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-d), nil
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.UnixMilli(int64(secs * 1000)), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// queryStep returns the step of a range query, chosen from the span when empty
+func queryStep(step string, span time.Duration) (time.Duration, error) {
+	if step == "" {
+		return max(span/queryRangePoints, time.Second).Truncate(time.Second), nil
+	}
+	d, err := time.ParseDuration(step)
+	if err != nil {
+		if secs, numErr := strconv.ParseFloat(step, 64); numErr == nil {
+			d, err = time.Duration(secs*float64(time.Second)), nil
+		}
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: invalid step %q", ErrInvalidPrometheusQuery, step)
+	}
+	if span/d > maxQueryRangePoints {
+		return 0, fmt.Errorf("%w: step %s returns more than %d points", ErrInvalidPrometheusQuery, step, maxQueryRangePoints)
+	}
+	return d, nil
+}
+
+// ============== History ==============
+
+// History returns the user's past queries matching the filter, newest first, and
+// the number of matches
+func (s *PrometheusQueryService) History(userID uuid.UUID, filter *model.PrometheusQueryHistoryFilter) ([]model.PrometheusQuery, int64, error) {
+	query := s.db.Model(&model.PrometheusQuery{}).Where("user_id = ?", userID)
+	if filter.DataSourceID != nil {
+		query = query.Where("data_source_id = ?", *filter.DataSourceID)
+	}
+	if filter.Success != nil {
+		query = query.Where("success = ?", *filter.Success)
+	}
+	if filter.QueryType != "" {
+		query = query.Where("query_type = ?", filter.QueryType)
+	}
+	if filter.Search != "" {
+		query = query.Where("query ILIKE ?", sanitize.Contains(filter.Search))
+	}
+	if filter.MinDuration > 0 {
+		query = query.Where("duration >= ?", filter.MinDuration)
+	}
+	if filter.MaxDuration > 0 {
+		query = query.Where("duration <= ?", filter.MaxDuration)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	var entries []model.PrometheusQuery
+	if err := query.Order("created_at DESC").Limit(limit).Offset(filter.Offset).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// ClearHistory deletes the user's query history, or only that of one data source,
+// and returns the number of entries deleted
+func (s *PrometheusQueryService) ClearHistory(userID uuid.UUID, dataSourceID *uuid.UUID) (int64, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if dataSourceID != nil {
+		query = query.Where("data_source_id = ?", *dataSourceID)
+	}
+	result := query.Delete(&model.PrometheusQuery{})
+	return result.RowsAffected, result.Error
+}
+
+// Run prunes the query history every hour until ctx is done
+func (s *PrometheusQueryService) Run(ctx context.Context) {
+	ticker := time.NewTicker(queryHistoryPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if deleted, err := s.Prune(); err != nil {
+			s.logger.Error("failed to prune prometheus query history", zap.Error(err))
+		} else if deleted > 0 {
+			s.logger.Info("pruned prometheus query history", zap.Int64("deleted", deleted))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune deletes history entries older than the retention setting and those beyond
+// the most recent ones each user keeps, returning the number deleted
+func (s *PrometheusQueryService) Prune() (int64, error) {
+	var deleted int64
+	if retention := s.settings.Duration(model.SettingQueryHistoryRetention); retention > 0 {
+		result := s.db.Where("created_at < ?", time.Now().Add(-retention)).Delete(&model.PrometheusQuery{})
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+	}
+	if keep := s.settings.Int(model.SettingQueryHistoryPerUser); keep > 0 {
+		result := s.db.Exec(`DELETE FROM prometheus_queries WHERE id IN (
+			SELECT id FROM (
+				SELECT id, row_number() OVER (PARTITION BY user_id ORDER BY created_at DESC) AS position
+				FROM prometheus_queries
+			) ranked WHERE position > ?
+		)`, keep)
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+	}
+	return deleted, nil
+}
+
+// ============== Saved Queries ==============
+
+// Save saves a query for the user, copying it from a history entry when one is given
+func (s *PrometheusQueryService) Save(userID uuid.UUID, req *model.SavePrometheusQueryRequest) (*model.PrometheusSavedQuery, error) {
+	saved := &model.PrometheusSavedQuery{
+		UserID:      userID,
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Query:       req.Query,
+		QueryType:   req.QueryType,
+		StartTime:   req.StartTime,
+		EndTime:     req.EndTime,
+		Step:        req.Step,
+		Starred:     req.Starred,
+	}
+	if req.DataSourceID != nil {
+		saved.DataSourceID = *req.DataSourceID
+	}
+	if req.HistoryID != nil {
+		var entry model.PrometheusQuery
+		if err := s.db.Where("id = ? AND user_id = ?", *req.HistoryID, userID).First(&entry).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrQueryHistoryNotFound
+			}
+			return nil, err
+		}
+		saved.DataSourceID = entry.DataSourceID
+		saved.Query = entry.Query
+		saved.QueryType = entry.QueryType
+		saved.StartTime = entry.StartTime
+		saved.EndTime = entry.EndTime
+		saved.Step = entry.Step
+	}
+	if saved.QueryType == "" {
+		saved.QueryType = "instant"
+	}
+	if err := s.validateSaved(saved); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(saved).Error; err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// validateSaved checks a saved query and that its data source belongs to its owner
+func (s *PrometheusQueryService) validateSaved(saved *model.PrometheusSavedQuery) error {
+	switch {
+	case saved.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidPrometheusQuery)
+	case strings.TrimSpace(saved.Query) == "":
+		return fmt.Errorf("%w: query is required", ErrInvalidPrometheusQuery)
+	case saved.QueryType != "instant" && saved.QueryType != "range":
+		return fmt.Errorf("%w: queryType must be instant or range", ErrInvalidPrometheusQuery)
+	}
+	if _, err := queryStep(saved.Step, 0); err != nil {
+		return err
+	}
+	for _, t := range []string{saved.StartTime, saved.EndTime} {
+		if _, err := parsePromTime(t, time.Time{}); err != nil {
+			return fmt.Errorf("%w: invalid time %q", ErrInvalidPrometheusQuery, t)
+		}
+	}
+	err := s.db.Select("id").Where("id = ? AND user_id = ?", saved.DataSourceID, saved.UserID).First(&model.PrometheusDataSource{}).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrPrometheusDataSourceNotFound
+	}
+	return err
+}
+
+// ListSaved returns the user's saved queries, starred ones first
+func (s *PrometheusQueryService) ListSaved(userID uuid.UUID, dataSourceID *uuid.UUID, starred *bool, search string) ([]model.PrometheusSavedQuery, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if dataSourceID != nil {
+		query = query.Where("data_source_id = ?", *dataSourceID)
+	}
+	if starred != nil {
+		query = query.Where("starred = ?", *starred)
+	}
+	if search != "" {
+		pattern := sanitize.Contains(search)
+		query = query.Where("(name ILIKE ? OR description ILIKE ? OR query ILIKE ?)", pattern, pattern, pattern)
+	}
+	var saved []model.PrometheusSavedQuery
+	if err := query.Order("starred DESC, name").Find(&saved).Error; err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// GetSaved returns one of the user's saved queries
+func (s *PrometheusQueryService) GetSaved(userID, id uuid.UUID) (*model.PrometheusSavedQuery, error) {
+	var saved model.PrometheusSavedQuery
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&saved).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSavedQueryNotFound
+		}
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// UpdateSaved changes the given fields of a saved query
+func (s *PrometheusQueryService) UpdateSaved(userID, id uuid.UUID, req *model.UpdatePrometheusSavedQueryRequest) (*model.PrometheusSavedQuery, error) {
+	saved, err := s.GetSaved(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.DataSourceID != nil {
+		saved.DataSourceID = *req.DataSourceID
+	}
+	if req.Name != nil {
+		saved.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		saved.Description = *req.Description
+	}
+	if req.Query != nil {
+		saved.Query = *req.Query
+	}
+	if req.QueryType != nil {
+		saved.QueryType = *req.QueryType
+	}
+	if req.StartTime != nil {
+		saved.StartTime = *req.StartTime
+	}
+	if req.EndTime != nil {
+		saved.EndTime = *req.EndTime
+	}
+	if req.Step != nil {
+		saved.Step = *req.Step
+	}
+	if req.Starred != nil {
+		saved.Starred = *req.Starred
+	}
+	if err := s.validateSaved(saved); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(saved).Error; err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// DeleteSaved deletes one of the user's saved queries
+func (s *PrometheusQueryService) DeleteSaved(userID, id uuid.UUID) error {
+	result := s.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.PrometheusSavedQuery{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSavedQueryNotFound
+	}
+	return nil
+}
+
+// RunSaved executes a saved query, over its own time range unless req overrides it
+func (s *PrometheusQueryService) RunSaved(ctx context.Context, userID, id uuid.UUID, req *model.RunPrometheusSavedQueryRequest) (*model.PrometheusQueryResponse, error) {
+	saved, err := s.GetSaved(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	query := &model.PrometheusQueryRequest{
+		Query:     saved.Query,
+		QueryType: saved.QueryType,
+		StartTime: saved.StartTime,
+		EndTime:   saved.EndTime,
+		Step:      saved.Step,
+	}
+	if req.StartTime != "" {
+		query.StartTime = req.StartTime
+	}
+	if req.EndTime != "" {
+		query.EndTime = req.EndTime
+	}
+	if req.Step != "" {
+		query.Step = req.Step
+	}
+
+	response, err := s.Execute(ctx, userID, saved.DataSourceID, query)
+	if err == nil || errors.Is(err, ErrPrometheusQueryFailed) {
+		s.db.Model(saved).Updates(map[string]interface{}{
+			"run_count":   gorm.Expr("run_count + 1"),
+			"last_run_at": time.Now(),
+		})
+	}
+	return response, err
+}
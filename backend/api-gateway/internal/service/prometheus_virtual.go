@@ -0,0 +1,209 @@
+// Package service provides virtual data sources, which fan PromQL queries out to
+// several Prometheus-compatible data sources and merge their results
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// PrometheusQuerier evaluates PromQL against a data source, physical or virtual
+type PrometheusQuerier interface {
+	Query(ctx context.Context, query string, at time.Time) ([]model.PrometheusSeries, []string, error)
+	QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]model.PrometheusSeries, []string, error)
+	LabelValues(ctx context.Context, label string, matchers []string, start, end time.Time) ([]string, []string, error)
+	LabelNames(ctx context.Context, matchers []string, start, end time.Time) ([]string, []string, error)
+}
+
+// NewDataSourceQuerier returns a client of the data source. A virtual data source
+// gets a client of the members its owner still has.
+func NewDataSourceQuerier(db *gorm.DB, ds *model.PrometheusDataSource) (PrometheusQuerier, error) {
+	if ds.Flavor != model.DSFlavorVirtual {
+		return NewPrometheusClient(ds)
+	}
+	if len(ds.MemberIDs) == 0 {
+		return nil, fmt.Errorf("virtual data source has no members")
+	}
+
+	var sources []model.PrometheusDataSource
+	err := db.Where("id IN ? AND user_id = ? AND flavor <> ?", []string(ds.MemberIDs), ds.UserID, model.DSFlavorVirtual).
+		Order("name").Find(&sources).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("none of the members of the virtual data source exist")
+	}
+
+	client := &virtualPrometheusClient{missing: len(ds.MemberIDs) - len(sources)}
+	for i := range sources {
+		member := virtualMember{name: sources[i].Name}
+		member.client, member.err = NewPrometheusClient(&sources[i])
+		client.members = append(client.members, member)
+	}
+	return client, nil
+}
+
+// virtualMember is a member of a virtual data source and its client
+type virtualMember struct {
+	name   string
+	client *PrometheusClient
+	err    error // Set when the member's configuration is invalid
+}
+
+// virtualPrometheusClient queries every member of a virtual data source in
+// parallel and merges their series, each labelled with the member it came from.
+// Members that fail are reported as warnings; a query fails only when every
+// member does.
+type virtualPrometheusClient struct {
+	members []virtualMember
+	missing int // Members that have been deleted since
+}
+
+func (c *virtualPrometheusClient) Query(ctx context.Context, query string, at time.Time) ([]model.PrometheusSeries, []string, error) {
+	return c.fanOut(func(client *PrometheusClient) ([]model.PrometheusSeries, []string, error) {
+		return client.Query(ctx, query, at)
+	})
+}
+
+func (c *virtualPrometheusClient) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]model.PrometheusSeries, []string, error) {
+	return c.fanOut(func(client *PrometheusClient) ([]model.PrometheusSeries, []string, error) {
+		return client.QueryRange(ctx, query, start, end, step)
+	})
+}
+
+// LabelValues returns the values of the label at any member. The source label
+// has the names of the members.
+func (c *virtualPrometheusClient) LabelValues(ctx context.Context, label string, matchers []string, start, end time.Time) ([]string, []string, error) {
+	if label == model.DSVirtualSourceLabel && len(matchers) == 0 {
+		names := make([]string, len(c.members))
+		for i, member := range c.members {
+			names[i] = member.name
+		}
+		return names, nil, nil
+	}
+	return c.fanOutStrings(func(client *PrometheusClient) ([]string, []string, error) {
+		return client.LabelValues(ctx, label, matchers, start, end)
+	})
+}
+
+// LabelNames returns the label names at any member, and the source label
+func (c *virtualPrometheusClient) LabelNames(ctx context.Context, matchers []string, start, end time.Time) ([]string, []string, error) {
+	names, warnings, err := c.fanOutStrings(func(client *PrometheusClient) ([]string, []string, error) {
+		return client.LabelNames(ctx, matchers, start, end)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if i := sort.SearchStrings(names, model.DSVirtualSourceLabel); i == len(names) || names[i] != model.DSVirtualSourceLabel {
+		names = append(names[:i], append([]string{model.DSVirtualSourceLabel}, names[i:]...)...)
+	}
+	return names, warnings, nil
+}
+
+// fanOutStrings runs a metadata query against every member and returns the sorted
+// union of the answers
+func (c *virtualPrometheusClient) fanOutStrings(query func(*PrometheusClient) ([]string, []string, error)) ([]string, []string, error) {
+	answers, _, warnings, err := fanOutMembers(c, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	seen := make(map[string]bool)
+	values := []string{}
+	for _, answer := range answers {
+		for _, value := range answer {
+			if !seen[value] {
+				seen[value] = true
+				values = append(values, value)
+			}
+		}
+	}
+	sort.Strings(values)
+	return values, warnings, nil
+}
+
+// fanOut runs query against every member and merges the results in member order
+func (c *virtualPrometheusClient) fanOut(query func(*PrometheusClient) ([]model.PrometheusSeries, []string, error)) ([]model.PrometheusSeries, []string, error) {
+	answers, names, warnings, err := fanOutMembers(c, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	series := []model.PrometheusSeries{}
+	for i, answer := range answers {
+		for _, s := range answer {
+			series = append(series, withSourceLabel(s, names[i]))
+		}
+	}
+	return series, warnings, nil
+}
+
+// fanOutMembers runs query against every member in parallel and returns the
+// answers of the members that succeeded, in member order, with their names
+func fanOutMembers[T any](c *virtualPrometheusClient, query func(*PrometheusClient) (T, []string, error)) ([]T, []string, []string, error) {
+	type memberResult struct {
+		answer   T
+		warnings []string
+		err      error
+	}
+	results := make([]memberResult, len(c.members))
+	var wg sync.WaitGroup
+	for i, member := range c.members {
+		if member.err != nil {
+			results[i].err = member.err
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i].answer, results[i].warnings, results[i].err = query(member.client)
+		}()
+	}
+	wg.Wait()
+
+	var answers []T
+	var names, warnings, failures []string
+	if c.missing > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d member data source(s) no longer exist", c.missing))
+	}
+	for i, result := range results {
+		name := c.members[i].name
+		if result.err != nil {
+			failures = append(failures, name+": "+result.err.Error())
+			continue
+		}
+		for _, warning := range result.warnings {
+			warnings = append(warnings, name+": "+warning)
+		}
+		answers = append(answers, result.answer)
+		names = append(names, name)
+	}
+	if len(failures) == len(c.members) {
+		return nil, nil, nil, fmt.Errorf("every member data source failed: %s", strings.Join(failures, "; "))
+	}
+	for _, failure := range failures {
+		warnings = append(warnings, "partial response, "+failure)
+	}
+	return answers, names, warnings, nil
+}
+
+// withSourceLabel labels a series with the member it came from. A source label of
+// the series' own is kept as exported_source, as Prometheus does on label clashes.
+func withSourceLabel(s model.PrometheusSeries, member string) model.PrometheusSeries {
+	metric := make(map[string]string, len(s.Metric)+1)
+	for k, v := range s.Metric {
+		metric[k] = v
+	}
+	if own, ok := metric[model.DSVirtualSourceLabel]; ok {
+		metric["exported_"+model.DSVirtualSourceLabel] = own
+	}
+	metric[model.DSVirtualSourceLabel] = member
+	s.Metric = metric
+	return s
+}
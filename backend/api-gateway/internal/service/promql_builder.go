@@ -0,0 +1,124 @@
+// Package service provides builders of PromQL for common query patterns
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+var (
+	// promMetricName and promLabelName are the names Prometheus accepts
+	promMetricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	promLabelName  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	// promWindowPattern is a PromQL duration such as 5m or 1h30m, or a dashboard variable
+	promWindowPattern = regexp.MustCompile(`^(([0-9]+(ms|s|m|h|d|w|y))+|\$\w+|\$\{\w+\})$`)
+)
+
+// defaultPromQLWindow is the range of rate() when a query names none; dashboards
+// expand it from their step and other queries get 5m
+const defaultPromQLWindow = "$__rate_interval"
+
+// BuildPromQL renders a query built from a common pattern. Classic histograms
+// are read through their _bucket, _sum and _count series, native ones directly.
+func BuildPromQL(q *model.PromQLQuery) (string, error) {
+	if !promMetricName.MatchString(q.Metric) {
+		return "", fmt.Errorf("%w: invalid metric name %q", ErrInvalidPrometheusQuery, q.Metric)
+	}
+	for _, label := range q.By {
+		if !promLabelName.MatchString(label) {
+			return "", fmt.Errorf("%w: invalid label name %q", ErrInvalidPrometheusQuery, label)
+		}
+	}
+	window := q.Window
+	if window == "" {
+		window = defaultPromQLWindow
+	}
+	if !promWindowPattern.MatchString(window) {
+		return "", fmt.Errorf("%w: invalid window %q", ErrInvalidPrometheusQuery, window)
+	}
+	matchers, err := promSelectorMatchers(q.Matchers)
+	if err != nil {
+		return "", err
+	}
+
+	rate := func(suffix string) string {
+		return fmt.Sprintf("rate(%s%s%s[%s])", q.Metric, suffix, matchers, window)
+	}
+	switch q.Kind {
+	case model.PromQLRate:
+		return promSumBy(q.By, rate("")), nil
+	case model.PromQLIncrease:
+		return promSumBy(q.By, fmt.Sprintf("increase(%s%s[%s])", q.Metric, matchers, window)), nil
+	case model.PromQLQuantile:
+		if q.Quantile < 0 || q.Quantile > 1 {
+			return "", fmt.Errorf("%w: quantile must be between 0 and 1", ErrInvalidPrometheusQuery)
+		}
+		phi := strconv.FormatFloat(q.Quantile, 'f', -1, 64)
+		if q.Native {
+			return fmt.Sprintf("histogram_quantile(%s, %s)", phi, promSumBy(q.By, rate(""))), nil
+		}
+		by := []string{"le"}
+		for _, label := range q.By {
+			if label != "le" {
+				by = append(by, label)
+			}
+		}
+		return fmt.Sprintf("histogram_quantile(%s, %s)", phi, promSumBy(by, rate("_bucket"))), nil
+	case model.PromQLAverage:
+		if q.Native {
+			sum := promSumBy(q.By, rate(""))
+			return fmt.Sprintf("histogram_sum(%s) / histogram_count(%s)", sum, sum), nil
+		}
+		return fmt.Sprintf("%s / %s", promSumBy(q.By, rate("_sum")), promSumBy(q.By, rate("_count"))), nil
+	}
+	return "", fmt.Errorf("%w: kind must be rate, increase, quantile or average", ErrInvalidPrometheusQuery)
+}
+
+// promSumBy sums an expression, keeping the labels in by
+func promSumBy(by []string, expr string) string {
+	if len(by) == 0 {
+		return "sum(" + expr + ")"
+	}
+	return "sum by (" + strings.Join(by, ", ") + ") (" + expr + ")"
+}
+
+// promSelectorMatchers renders label matchers as a selector, empty without any
+func promSelectorMatchers(matchers []model.PromQLMatcher) (string, error) {
+	if len(matchers) == 0 {
+		return "", nil
+	}
+	parts := make([]string, len(matchers))
+	for i, m := range matchers {
+		if !promLabelName.MatchString(m.Label) {
+			return "", fmt.Errorf("%w: invalid label name %q", ErrInvalidPrometheusQuery, m.Label)
+		}
+		op := m.Op
+		switch op {
+		case "":
+			op = "="
+		case "=", "!=", "=~", "!~":
+		default:
+			return "", fmt.Errorf("%w: matcher operator must be =, !=, =~ or !~", ErrInvalidPrometheusQuery)
+		}
+		parts[i] = m.Label + op + strconv.Quote(m.Value)
+	}
+	return "{" + strings.Join(parts, ", ") + "}", nil
+}
+
+// promQueryExpr returns the expression of a query given as PromQL or built from
+// a pattern, with the default window of rate() when the query runs outside a
+// dashboard
+func promQueryExpr(expr string, builder *model.PromQLQuery) (string, error) {
+	if strings.TrimSpace(expr) != "" || builder == nil {
+		return expr, nil
+	}
+	built, err := BuildPromQL(builder)
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(built, defaultPromQLWindow, "5m"), nil
+}
@@ -0,0 +1,374 @@
+// Package service provides usage accounting and quota enforcement
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidQuota is returned for quotas that cannot be set
+var ErrInvalidQuota = errors.New("invalid quota")
+
+// quotaDefaults are the settings holding the default per-user limit of each resource
+var quotaDefaults = map[string]string{
+	model.QuotaResourceClusters:     model.SettingQuotaUserClusters,
+	model.QuotaResourceHosts:        model.SettingQuotaUserHosts,
+	model.QuotaResourceDataSources:  model.SettingQuotaUserDataSources,
+	model.QuotaResourceDashboards:   model.SettingQuotaUserDashboards,
+	model.QuotaResourceLLMTokens:    model.SettingQuotaUserLLMTokens,
+	model.QuotaResourcePortForwards: model.SettingQuotaUserPortForwards,
+	model.QuotaResourceStagedBytes:  model.SettingQuotaUserStagedBytes,
+}
+
+// QuotaExceededError is returned when an action would take a user or org over a
+// quota. With a soft quota the action may go ahead and the error is a warning.
+type QuotaExceededError struct {
+	Resource string
+	Scope    string
+	Subject  string
+	Limit    int64
+	Used     int64
+	Soft     bool
+}
+
+func (e *QuotaExceededError) Error() string {
+	if e.Scope == model.QuotaScopeOrg {
+		return fmt.Sprintf("%s quota of org %s exceeded: %d of %d used", e.Resource, e.Subject, e.Used, e.Limit)
+	}
+	return fmt.Sprintf("%s quota exceeded: %d of %d used", e.Resource, e.Used, e.Limit)
+}
+
+// QuotaService accounts for what users and orgs consume and enforces their quotas.
+// Usage is counted from the resources themselves, so it cannot drift.
+type QuotaService struct {
+	db       *gorm.DB
+	settings *SettingsService
+}
+
+// NewQuotaService creates a new quota service
+func NewQuotaService(db *gorm.DB, settings *SettingsService) *QuotaService {
+	return &QuotaService{db: db, settings: settings}
+}
+
+// Check returns a *QuotaExceededError if adding more of resource would exceed a
+// quota of the user or of the user's org. A hard quota is reported before a soft
+// one. Super admins have no quotas.
+func (s *QuotaService) Check(userID uuid.UUID, resource string, adding int64) error {
+	if set, err := model.CachedPermissionSet(s.db, userID); err != nil {
+		return err
+	} else if set.SuperAdmin {
+		return nil
+	}
+
+	var user model.User
+	if err := s.db.Select("id", "department").First(&user, "id = ?", userID).Error; err != nil {
+		return err
+	}
+	quotas, err := s.quotasFor(&user, resource)
+	if err != nil {
+		return err
+	}
+
+	var warning *QuotaExceededError
+	if limit, soft := s.userLimit(quotas, userID, resource); limit != nil {
+		usage, err := s.usage(resource, s.db.Model(&model.User{}).Select("id").Where("id = ?", userID))
+		if err != nil {
+			return err
+		}
+		if used := usage[userID]; used+adding > *limit {
+			exceeded := &QuotaExceededError{Resource: resource, Scope: model.QuotaScopeUser, Subject: userID.String(), Limit: *limit, Used: used, Soft: soft}
+			if !soft {
+				return exceeded
+			}
+			warning = exceeded
+		}
+	}
+
+	if quota, ok := quotas[quotaKey(model.QuotaScopeOrg, user.Department, resource)]; ok && user.Department != "" {
+		usage, err := s.usage(resource, s.db.Model(&model.User{}).Select("id").Where("department = ?", user.Department))
+		if err != nil {
+			return err
+		}
+		var used int64
+		for _, n := range usage {
+			used += n
+		}
+		if used+adding > quota.Limit {
+			exceeded := &QuotaExceededError{Resource: resource, Scope: model.QuotaScopeOrg, Subject: user.Department, Limit: quota.Limit, Used: used, Soft: quota.Soft}
+			if !quota.Soft || warning == nil {
+				return exceeded
+			}
+		}
+	}
+	if warning != nil {
+		return warning
+	}
+	return nil
+}
+
+// Limit returns the limit of a user or org on resource and whether it is soft. A
+// nil limit is unlimited.
+func (s *QuotaService) Limit(scope, subject, resource string) (*int64, bool, error) {
+	var quota model.ResourceQuota
+	err := s.db.Where("scope = ? AND subject = ? AND resource = ?", scope, subject, resource).First(&quota).Error
+	switch {
+	case err == nil:
+		limit := quota.Limit
+		return &limit, quota.Soft, nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, false, err
+	case scope == model.QuotaScopeUser:
+		if limit := int64(s.settings.Int(quotaDefaults[resource])); limit > 0 {
+			return &limit, false, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// UserUsage returns what a user consumes against the user's own limits
+func (s *QuotaService) UserUsage(userID uuid.UUID) (*model.UserUsage, error) {
+	summary, err := s.summarize(s.db.Model(&model.User{}).Where("id = ?", userID))
+	if err != nil {
+		return nil, err
+	}
+	if len(summary.Users) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &summary.Users[0], nil
+}
+
+// Summary returns what every user and org consumes
+func (s *QuotaService) Summary() (*model.UsageSummary, error) {
+	return s.summarize(s.db.Model(&model.User{}))
+}
+
+// ListQuotas returns the quotas, optionally only those of a scope
+func (s *QuotaService) ListQuotas(scope string) ([]model.ResourceQuota, error) {
+	query := s.db.Order("scope, subject, resource")
+	if scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	var quotas []model.ResourceQuota
+	err := query.Find(&quotas).Error
+	return quotas, err
+}
+
+// SetQuota creates or updates the quota of a user or org on a resource
+func (s *QuotaService) SetQuota(req *model.SetQuotaRequest, setBy uuid.UUID) (*model.ResourceQuota, error) {
+	if _, ok := quotaDefaults[req.Resource]; !ok {
+		return nil, fmt.Errorf("%w: unknown resource %q", ErrInvalidQuota, req.Resource)
+	}
+	if req.Limit < 0 {
+		return nil, fmt.Errorf("%w: limit must not be negative", ErrInvalidQuota)
+	}
+	switch req.Scope {
+	case model.QuotaScopeUser:
+		id, err := uuid.Parse(req.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("%w: subject of a user quota must be a user ID", ErrInvalidQuota)
+		}
+		if err := s.db.Select("id").First(&model.User{}, "id = ?", id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: user not found", ErrInvalidQuota)
+		} else if err != nil {
+			return nil, err
+		}
+		req.Subject = id.String()
+	case model.QuotaScopeOrg:
+		if req.Subject == "" {
+			return nil, fmt.Errorf("%w: subject of an org quota must be a department", ErrInvalidQuota)
+		}
+	default:
+		return nil, fmt.Errorf("%w: scope must be user or org", ErrInvalidQuota)
+	}
+
+	var quota model.ResourceQuota
+	err := s.db.Where("scope = ? AND subject = ? AND resource = ?", req.Scope, req.Subject, req.Resource).First(&quota).Error
+	switch {
+	case err == nil:
+		quota.Limit, quota.Soft = req.Limit, req.Soft
+		if err := s.db.Model(&quota).Updates(map[string]interface{}{"quota_limit": req.Limit, "soft": req.Soft}).Error; err != nil {
+			return nil, err
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		quota = model.ResourceQuota{Scope: req.Scope, Subject: req.Subject, Resource: req.Resource, Limit: req.Limit, Soft: req.Soft, CreatedBy: &setBy}
+		if err := s.db.Create(&quota).Error; err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// DeleteQuota removes a quota, returning its subject to the default limit
+func (s *QuotaService) DeleteQuota(id uuid.UUID) error {
+	result := s.db.Delete(&model.ResourceQuota{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// summarize builds the usage summary of the users selected by users
+func (s *QuotaService) summarize(users *gorm.DB) (*model.UsageSummary, error) {
+	var members []model.User
+	if err := users.Session(&gorm.Session{}).Select("id", "username", "department").Order("username").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	var quotas []model.ResourceQuota
+	if err := s.db.Find(&quotas).Error; err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]model.ResourceQuota, len(quotas))
+	for _, quota := range quotas {
+		byKey[quotaKey(quota.Scope, quota.Subject, quota.Resource)] = quota
+	}
+
+	usage := make(map[string]map[uuid.UUID]int64, len(model.QuotaResources))
+	for _, resource := range model.QuotaResources {
+		used, err := s.usage(resource, users.Session(&gorm.Session{}).Select("id"))
+		if err != nil {
+			return nil, err
+		}
+		usage[resource] = used
+	}
+
+	summary := &model.UsageSummary{PeriodStart: llmTokenPeriodStart(time.Now()), Users: []model.UserUsage{}, Orgs: []model.OrgUsage{}}
+	orgs := make(map[string]*model.OrgUsage)
+	for _, member := range members {
+		entry := model.UserUsage{
+			UserID:     member.ID,
+			Username:   member.Username,
+			Department: member.Department,
+			Resources:  make(map[string]model.ResourceUsage, len(model.QuotaResources)),
+		}
+		org := orgs[member.Department]
+		if org == nil && member.Department != "" {
+			org = &model.OrgUsage{Org: member.Department, Resources: make(map[string]model.ResourceUsage)}
+			orgs[member.Department] = org
+		}
+		if org != nil {
+			org.Users++
+		}
+
+		for _, resource := range model.QuotaResources {
+			used := usage[resource][member.ID]
+			limit, soft := s.userLimit(byKey, member.ID, resource)
+			entry.Resources[resource] = model.ResourceUsage{Used: used, Limit: limit, Soft: soft}
+			if org != nil {
+				total := org.Resources[resource]
+				total.Used += used
+				if quota, ok := byKey[quotaKey(model.QuotaScopeOrg, org.Org, resource)]; ok {
+					limit := quota.Limit
+					total.Limit, total.Soft = &limit, quota.Soft
+				}
+				org.Resources[resource] = total
+			}
+		}
+		summary.Users = append(summary.Users, entry)
+	}
+
+	for _, org := range orgs {
+		summary.Orgs = append(summary.Orgs, *org)
+	}
+	sort.Slice(summary.Orgs, func(i, j int) bool { return summary.Orgs[i].Org < summary.Orgs[j].Org })
+	return summary, nil
+}
+
+// quotasFor returns the user and org quotas on resource that apply to user, by quotaKey
+func (s *QuotaService) quotasFor(user *model.User, resource string) (map[string]model.ResourceQuota, error) {
+	var quotas []model.ResourceQuota
+	err := s.db.Where("resource = ? AND ((scope = ? AND subject = ?) OR (scope = ? AND subject = ?))", resource,
+		model.QuotaScopeUser, user.ID.String(), model.QuotaScopeOrg, user.Department).Find(&quotas).Error
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]model.ResourceQuota, len(quotas))
+	for _, quota := range quotas {
+		byKey[quotaKey(quota.Scope, quota.Subject, quota.Resource)] = quota
+	}
+	return byKey, nil
+}
+
+// userLimit returns the limit of a user on resource and whether it is soft: the
+// user's quota if there is one, or else the default from the settings, which is
+// hard. A nil limit is unlimited.
+func (s *QuotaService) userLimit(quotas map[string]model.ResourceQuota, userID uuid.UUID, resource string) (*int64, bool) {
+	if quota, ok := quotas[quotaKey(model.QuotaScopeUser, userID.String(), resource)]; ok {
+		limit := quota.Limit
+		return &limit, quota.Soft
+	}
+	if limit := int64(s.settings.Int(quotaDefaults[resource])); limit > 0 {
+		return &limit, false
+	}
+	return nil, false
+}
+
+// usage returns how much of resource each of the users selected by the users
+// subquery consumes
+func (s *QuotaService) usage(resource string, users *gorm.DB) (map[uuid.UUID]int64, error) {
+	var queries []*gorm.DB
+	switch resource {
+	case model.QuotaResourceClusters:
+		queries = append(queries, s.db.Model(&model.K8sCluster{}).Select("user_id, COUNT(*) AS total").Where("user_id IN (?)", users).Group("user_id"))
+	case model.QuotaResourceHosts:
+		queries = append(queries, s.db.Model(&model.Host{}).Select("registered_by AS user_id, COUNT(*) AS total").Where("registered_by IN (?)", users).Group("registered_by"))
+	case model.QuotaResourceDataSources:
+		for _, dataSource := range []interface{}{&model.PrometheusDataSource{}, &model.LogDataSource{}, &model.TraceDataSource{}} {
+			queries = append(queries, s.db.Model(dataSource).Select("user_id, COUNT(*) AS total").Where("user_id IN (?)", users).Group("user_id"))
+		}
+	case model.QuotaResourceDashboards:
+		queries = append(queries, s.db.Model(&model.PrometheusDashboard{}).Select("user_id, COUNT(*) AS total").Where("user_id IN (?)", users).Group("user_id"))
+	case model.QuotaResourceLLMTokens:
+		queries = append(queries, s.db.Model(&model.LLMMessage{}).
+			Select("llm_conversations.user_id AS user_id, COALESCE(SUM(llm_messages.tokens_used), 0) AS total").
+			Joins("JOIN llm_conversations ON llm_conversations.id = llm_messages.conversation_id").
+			Where("llm_conversations.user_id IN (?) AND llm_messages.created_at >= ?", users, llmTokenPeriodStart(time.Now())).
+			Group("llm_conversations.user_id"))
+	case model.QuotaResourcePortForwards:
+		queries = append(queries, s.db.Model(&model.PortForwardSession{}).Select("user_id, COUNT(*) AS total").
+			Where("user_id IN (?) AND status = ?", users, model.PortForwardActive).Group("user_id"))
+	case model.QuotaResourceStagedBytes:
+		// Staged files are kept until their task is deleted, together with its distribution
+		queries = append(queries, s.db.Model(&model.FileDistribution{}).
+			Select("batch_tasks.user_id AS user_id, COALESCE(SUM(file_distributions.file_size), 0) AS total").
+			Joins("JOIN batch_tasks ON batch_tasks.id = file_distributions.batch_task_id").
+			Where("batch_tasks.user_id IN (?)", users).
+			Group("batch_tasks.user_id"))
+	default:
+		return nil, fmt.Errorf("%w: unknown resource %q", ErrInvalidQuota, resource)
+	}
+
+	usage := make(map[uuid.UUID]int64)
+	for _, query := range queries {
+		var rows []struct {
+			UserID uuid.UUID
+			Total  int64
+		}
+		if err := query.Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", resource, err)
+		}
+		for _, row := range rows {
+			usage[row.UserID] += row.Total
+		}
+	}
+	return usage, nil
+}
+
+// llmTokenPeriodStart returns the start of the calendar month LLM tokens are counted in
+func llmTokenPeriodStart(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+}
+
+func quotaKey(scope, subject, resource string) string {
+	return scope + "/" + subject + "/" + resource
+}
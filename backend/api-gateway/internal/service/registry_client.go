@@ -0,0 +1,594 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+const (
+	// registryTimeout bounds one registry request
+	registryTimeout = 30 * time.Second
+	// registryMaxManifest caps the manifests and config blobs read
+	registryMaxManifest = 4 << 20
+	// registryTagPages caps the pages of tags read for one repository
+	registryTagPages    = 10
+	registryTagPageSize = 1000
+
+	dockerHubRegistry = "docker.io"
+	dockerHubAPIHost  = "registry-1.docker.io"
+)
+
+// Manifest media types the client accepts
+const (
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+var (
+	// imageRepositoryPattern matches repository paths as the distribution spec defines them
+	imageRepositoryPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	imageTagPattern        = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	imageDigestPattern     = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+	// ecrHostPattern matches ECR registry hosts and captures their region
+	ecrHostPattern = regexp.MustCompile(`^\d{12}\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+)
+
+// parseImageReference splits an image name as Kubernetes and Docker read it
+func parseImageReference(image string) (model.ImageReference, error) {
+	ref := model.ImageReference{}
+	name := strings.TrimSpace(image)
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest, name = name[i+1:], name[:i]
+		if !imageDigestPattern.MatchString(ref.Digest) {
+			return ref, fmt.Errorf("invalid digest in image %q", image)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i:], "/") {
+		ref.Tag, name = name[i+1:], name[:i]
+		if !imageTagPattern.MatchString(ref.Tag) {
+			return ref, fmt.Errorf("invalid tag in image %q", image)
+		}
+	}
+
+	ref.Registry, ref.Repository = dockerHubRegistry, name
+	if i := strings.Index(name, "/"); i >= 0 {
+		domain := name[:i]
+		if strings.ContainsAny(domain, ".:") || domain == "localhost" {
+			ref.Registry, ref.Repository = domain, name[i+1:]
+		}
+	}
+	if ref.Registry == "index.docker.io" || ref.Registry == dockerHubAPIHost {
+		ref.Registry = dockerHubRegistry
+	}
+	if ref.Registry == dockerHubRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	if !imageRepositoryPattern.MatchString(ref.Repository) {
+		return ref, fmt.Errorf("invalid repository in image %q", image)
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag, ref.ImplicitTag = "latest", true
+	}
+	return ref, nil
+}
+
+// imageReferenceString formats a reference back into a full image name
+func imageReferenceString(ref model.ImageReference) string {
+	name := ref.Registry + "/" + ref.Repository
+	if ref.Tag != "" {
+		name += ":" + ref.Tag
+	}
+	if ref.Digest != "" {
+		name += "@" + ref.Digest
+	}
+	return name
+}
+
+// registryError is a request the registry refused
+type registryError struct {
+	Status int
+	Err    error
+}
+
+func (e *registryError) Error() string { return e.Err.Error() }
+
+// registryClient reads manifests, config blobs and tags from a registry with the
+// distribution (Docker Registry V2) API, answering its Bearer or Basic challenges
+type registryClient struct {
+	baseURL  string
+	username string
+	password string
+	http     *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]string // Bearer tokens by repository
+}
+
+// newRegistryClient creates a client for a registry host. registry holds the
+// credentials configured for it, or is nil for anonymous access.
+func newRegistryClient(ctx context.Context, host string, registry *model.ContainerRegistry) (*registryClient, error) {
+	c := &registryClient{
+		baseURL: "https://" + host,
+		tokens:  make(map[string]string),
+		http: &http.Client{
+			Timeout: registryTimeout,
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+			},
+		},
+	}
+	if host == dockerHubRegistry {
+		c.baseURL = "https://" + dockerHubAPIHost
+	}
+	if strings.HasPrefix(host, "localhost") || strings.HasPrefix(host, "127.0.0.1") {
+		c.baseURL = "http://" + host
+	}
+	if registry == nil {
+		return c, nil
+	}
+
+	if u, err := url.Parse(registry.URL); err == nil && u.Scheme != "" && u.Host != "" {
+		c.baseURL = u.Scheme + "://" + u.Host
+	}
+	if registry.InsecureSkipTLS {
+		c.http.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	c.username, c.password = registry.Username, registry.Password
+	if registry.Type == model.RegistryECR {
+		region := registry.Region
+		if match := ecrHostPattern.FindStringSubmatch(host); region == "" && match != nil {
+			region = match[1]
+		}
+		if region == "" {
+			return nil, fmt.Errorf("no AWS region for ECR registry %s", registry.Name)
+		}
+		password, err := ecrAuthorizationToken(ctx, c.http, region, registry.Username, registry.Password)
+		if err != nil {
+			return nil, err
+		}
+		c.username, c.password = "AWS", password
+	}
+	return c, nil
+}
+
+// get requests a path of the V2 API for repository, authenticating when challenged
+func (c *registryClient) get(ctx context.Context, repository, path string, accept ...string) (*http.Response, error) {
+	resp, err := c.do(ctx, repository, c.baseURL+path, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := c.authenticate(ctx, repository, challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = c.do(ctx, repository, c.baseURL+path, accept); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &registryError{
+			Status: resp.StatusCode,
+			Err:    fmt.Errorf("registry returned %d for %s: %s", resp.StatusCode, path, strings.TrimSpace(string(message))),
+		}
+	}
+	return resp, nil
+}
+
+func (c *registryClient) do(ctx context.Context, repository, target string, accept []string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "myops-api-gateway")
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+	c.mu.Lock()
+	token, ok := c.tokens[repository]
+	c.mu.Unlock()
+	switch {
+	case ok && token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case ok && c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// authenticate answers a WWW-Authenticate challenge. Basic challenges are answered
+// with the credentials on every request; Bearer challenges with a token fetched from
+// the realm, with the credentials when there are any.
+func (c *registryClient) authenticate(ctx context.Context, repository, challenge string) error {
+	scheme, params := parseAuthChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.username == "" {
+			return &registryError{Status: http.StatusUnauthorized, Err: errors.New("registry requires credentials")}
+		}
+		c.mu.Lock()
+		c.tokens[repository] = ""
+		c.mu.Unlock()
+		return nil
+	case "bearer":
+	default:
+		return &registryError{Status: http.StatusUnauthorized, Err: fmt.Errorf("unsupported registry authentication %q", scheme)}
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" && repository != "" {
+		scope = "repository:" + repository + ":pull"
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "myops-api-gateway")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &registryError{
+			Status: http.StatusUnauthorized,
+			Err:    fmt.Errorf("token request returned %d: %s", resp.StatusCode, strings.TrimSpace(string(message))),
+		}
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, registryMaxManifest)).Decode(&body); err != nil {
+		return fmt.Errorf("invalid token response: %w", err)
+	}
+	token := body.Token
+	if token == "" {
+		token = body.AccessToken
+	}
+	if token == "" {
+		return errors.New("token response has no token")
+	}
+	c.mu.Lock()
+	c.tokens[repository] = token
+	c.mu.Unlock()
+	return nil
+}
+
+// parseAuthChallenge splits a WWW-Authenticate header such as
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseAuthChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[key] = value[1:]
+				break
+			}
+			params[key], rest = value[1:end+1], value[end+2:]
+		} else {
+			params[key], rest, _ = strings.Cut(value, ",")
+		}
+		rest = strings.TrimLeft(strings.TrimSpace(rest), ",")
+		rest = strings.TrimSpace(rest)
+	}
+	return scheme, params
+}
+
+// registryManifest is the part of an image manifest or index the client reads
+type registryManifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+		Size   int64  `json:"size"`
+	} `json:"config"`
+	Layers []struct {
+		Size int64 `json:"size"`
+	} `json:"layers"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+			Variant      string `json:"variant"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// registryImageConfig is the part of an image config blob the client reads
+type registryImageConfig struct {
+	Created      *time.Time `json:"created"`
+	OS           string     `json:"os"`
+	Architecture string     `json:"architecture"`
+	Config       struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+// manifest fetches the manifest reference (a tag or digest) points at and its digest
+func (c *registryClient) manifest(ctx context.Context, repository, reference string) (*registryManifest, string, error) {
+	resp, err := c.get(ctx, repository, "/v2/"+repository+"/manifests/"+reference,
+		mediaTypeOCIIndex, mediaTypeOCIManifest, mediaTypeDockerManifestList, mediaTypeDockerManifest)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, registryMaxManifest))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest registryManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, "", fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType, _, _ = strings.Cut(resp.Header.Get("Content-Type"), ";")
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		sum := sha256.Sum256(body)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return &manifest, digest, nil
+}
+
+// Inspect reads the manifest of ref and the config blob of its image. Indexes are
+// followed to their linux/amd64 image, or their first one.
+func (c *registryClient) Inspect(ctx context.Context, ref model.ImageReference) (*model.ImageDetail, error) {
+	reference := ref.Digest
+	if reference == "" {
+		reference = ref.Tag
+	}
+	manifest, digest, err := c.manifest(ctx, ref.Repository, reference)
+	if err != nil {
+		return nil, err
+	}
+	detail := &model.ImageDetail{
+		Image:     imageReferenceString(ref),
+		Reference: ref,
+		Digest:    digest,
+		MediaType: manifest.MediaType,
+		Labels:    map[string]string{},
+	}
+
+	if len(manifest.Manifests) > 0 {
+		chosen := manifest.Manifests[0].Digest
+		for _, m := range manifest.Manifests {
+			if m.Platform.OS == "unknown" {
+				// Attestations stored next to the images
+				continue
+			}
+			detail.Platforms = append(detail.Platforms, model.ImagePlatform{
+				OS:           m.Platform.OS,
+				Architecture: m.Platform.Architecture,
+				Variant:      m.Platform.Variant,
+				Digest:       m.Digest,
+			})
+			if m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
+				chosen = m.Digest
+			}
+		}
+		if manifest, _, err = c.manifest(ctx, ref.Repository, chosen); err != nil {
+			return nil, err
+		}
+	}
+
+	detail.Size = manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		detail.Size += layer.Size
+	}
+	if manifest.Config.Digest == "" {
+		return detail, nil
+	}
+
+	resp, err := c.get(ctx, ref.Repository, "/v2/"+ref.Repository+"/blobs/"+manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var config registryImageConfig
+	if err := json.NewDecoder(io.LimitReader(resp.Body, registryMaxManifest)).Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid image config: %w", err)
+	}
+	detail.Created = config.Created
+	detail.OS, detail.Architecture = config.OS, config.Architecture
+	if config.Config.Labels != nil {
+		detail.Labels = config.Config.Labels
+	}
+	return detail, nil
+}
+
+// Tags lists the tags of a repository, following the registry's pagination
+func (c *registryClient) Tags(ctx context.Context, repository string) ([]string, bool, error) {
+	path := fmt.Sprintf("/v2/%s/tags/list?n=%d", repository, registryTagPageSize)
+	var tags []string
+	for page := 0; path != ""; page++ {
+		if page == registryTagPages {
+			return tags, true, nil
+		}
+		resp, err := c.get(ctx, repository, path)
+		if err != nil {
+			return nil, false, err
+		}
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(io.LimitReader(resp.Body, registryMaxManifest)).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid tag list: %w", err)
+		}
+		tags = append(tags, body.Tags...)
+		path = nextLink(resp.Header.Get("Link"))
+	}
+	return tags, false, nil
+}
+
+// nextLink returns the path of a Link: </v2/...>; rel="next" header
+func nextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		target, params, ok := strings.Cut(link, ";")
+		if !ok || !strings.Contains(params, `rel="next"`) {
+			continue
+		}
+		target = strings.Trim(strings.TrimSpace(target), "<>")
+		if u, err := url.Parse(target); err == nil {
+			return u.RequestURI()
+		}
+	}
+	return ""
+}
+
+// ecrAuthorizationToken exchanges an AWS access key for an ECR registry password
+// with the GetAuthorizationToken API
+func ecrAuthorizationToken(ctx context.Context, client *http.Client, region, accessKey, secretKey string) (string, error) {
+	if accessKey == "" || secretKey == "" {
+		return "", errors.New("ECR registries need an AWS access key")
+	}
+	host := "api.ecr." + region + ".amazonaws.com"
+	body := []byte("{}")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+	signAWSRequest(req, sha256Hex(body), region, "ecr", accessKey, secretKey, time.Now())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("ECR token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", &registryError{
+			Status: http.StatusUnauthorized,
+			Err:    fmt.Errorf("ECR token request returned %d: %s", resp.StatusCode, strings.TrimSpace(string(message))),
+		}
+	}
+	var result struct {
+		AuthorizationData []struct {
+			AuthorizationToken string `json:"authorizationToken"`
+		} `json:"authorizationData"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || len(result.AuthorizationData) == 0 {
+		return "", errors.New("invalid ECR token response")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(result.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return "", errors.New("invalid ECR authorization token")
+	}
+	// The token is AWS:<password>
+	_, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", errors.New("invalid ECR authorization token")
+	}
+	return password, nil
+}
+
+// signAWSRequest signs a request with AWS Signature Version 4. Host, Content-Type
+// and every X-Amz- header already set are signed.
+func signAWSRequest(req *http.Request, payloadHash, region, awsService, accessKey, secretKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + awsService + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, awsService)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,701 @@
+// Package service provides pushing of agent host metrics to remote_write endpoints
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// remoteWriteTick is how often queues are checked for batches that are due
+	remoteWriteTick = time.Second
+	// remoteWriteQueueBatches is how many batches a queue holds before dropping the oldest series
+	remoteWriteQueueBatches = 20
+	// remoteWriteRetryBase and remoteWriteRetryMax bound the backoff between attempts
+	remoteWriteRetryBase = time.Second
+	remoteWriteRetryMax  = 30 * time.Second
+
+	defaultRemoteWriteBatchSize     = 500
+	maxRemoteWriteBatchSize         = 10000
+	defaultRemoteWriteFlushInterval = 15
+	defaultRemoteWriteRetries       = 5
+	maxRemoteWriteRetries           = 20
+)
+
+var (
+	// ErrInvalidRemoteWriteTarget is returned when a target's configuration is malformed
+	ErrInvalidRemoteWriteTarget = errors.New("invalid remote write target")
+	// ErrRemoteWriteTargetNotFound is returned when the target does not exist
+	ErrRemoteWriteTargetNotFound = errors.New("remote write target not found")
+)
+
+// prometheusLabelName matches valid label names
+var prometheusLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// RemoteWriteService pushes the metrics agents report to the remote_write targets
+// whose host group includes the reporting host. Each target has an in-memory
+// queue that is flushed in batches with retries.
+type RemoteWriteService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+
+	mu     sync.Mutex
+	queues map[uuid.UUID]*remoteWriteQueue
+}
+
+// remoteWriteQueue holds the series waiting for one target
+type remoteWriteQueue struct {
+	target     model.RemoteWriteTarget
+	client     *remoteWriteClient
+	hostLabels map[string]string
+	hostTags   []string
+	relabel    []compiledRelabel
+
+	pending   []remoteWriteSeries
+	sending   bool
+	lastFlush time.Time
+	status    model.RemoteWriteStatus
+}
+
+// compiledRelabel is a RelabelConfig with defaults applied and its regex compiled
+type compiledRelabel struct {
+	model.RelabelConfig
+	regex *regexp.Regexp
+}
+
+// NewRemoteWriteService creates a new remote write service
+func NewRemoteWriteService(db *gorm.DB, logger *zap.Logger) *RemoteWriteService {
+	return &RemoteWriteService{db: db, logger: logger, queues: make(map[uuid.UUID]*remoteWriteQueue)}
+}
+
+// ============== Configuration ==============
+
+// Reload rebuilds the queues from the enabled targets. Pending series of targets
+// that still exist are kept, as are their delivery statistics.
+func (s *RemoteWriteService) Reload() error {
+	var targets []model.RemoteWriteTarget
+	if err := s.db.Where("enabled = ?", true).Find(&targets).Error; err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queues := make(map[uuid.UUID]*remoteWriteQueue, len(targets))
+	for i := range targets {
+		q, err := newRemoteWriteQueue(&targets[i])
+		if err != nil {
+			s.logger.Warn("skipping invalid remote write target", zap.String("target", targets[i].Name), zap.Error(err))
+			continue
+		}
+		// An in-flight flush of the old queue finds it empty and stops
+		if old, ok := s.queues[q.target.ID]; ok {
+			q.pending, q.status, q.lastFlush = old.pending, old.status, old.lastFlush
+			old.pending = nil
+		}
+		queues[q.target.ID] = q
+	}
+	s.queues = queues
+	return nil
+}
+
+func newRemoteWriteQueue(target *model.RemoteWriteTarget) (*remoteWriteQueue, error) {
+	client, err := newRemoteWriteClient(target)
+	if err != nil {
+		return nil, err
+	}
+	resp := target.Response()
+	relabel, err := compileRelabel(resp.Relabel)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteWriteQueue{
+		target:     *target,
+		client:     client,
+		hostLabels: resp.HostLabels,
+		hostTags:   resp.HostTags,
+		relabel:    relabel,
+		lastFlush:  time.Now(),
+	}, nil
+}
+
+// compileRelabel validates relabel configs and fills in Prometheus' defaults
+func compileRelabel(configs []model.RelabelConfig) ([]compiledRelabel, error) {
+	compiled := make([]compiledRelabel, 0, len(configs))
+	for i, c := range configs {
+		if c.Action == "" {
+			c.Action = model.RelabelReplace
+		}
+		if c.Separator == "" {
+			c.Separator = ";"
+		}
+		if c.Regex == "" {
+			c.Regex = "(.*)"
+		}
+		if c.Replacement == "" {
+			c.Replacement = "$1"
+		}
+		regex, err := regexp.Compile("^(?:" + c.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%w: relabel %d: invalid regex: %v", ErrInvalidRemoteWriteTarget, i+1, err)
+		}
+		switch c.Action {
+		case model.RelabelReplace:
+			if c.TargetLabel == "" {
+				return nil, fmt.Errorf("%w: relabel %d: replace needs a targetLabel", ErrInvalidRemoteWriteTarget, i+1)
+			}
+		case model.RelabelKeep, model.RelabelDrop:
+			if len(c.SourceLabels) == 0 {
+				return nil, fmt.Errorf("%w: relabel %d: %s needs sourceLabels", ErrInvalidRemoteWriteTarget, i+1, c.Action)
+			}
+		case model.RelabelLabelMap, model.RelabelLabelDrop, model.RelabelLabelKeep:
+		default:
+			return nil, fmt.Errorf("%w: relabel %d: unknown action %q", ErrInvalidRemoteWriteTarget, i+1, c.Action)
+		}
+		compiled = append(compiled, compiledRelabel{RelabelConfig: c, regex: regex})
+	}
+	return compiled, nil
+}
+
+// List returns every target with its delivery status
+func (s *RemoteWriteService) List() ([]model.RemoteWriteTargetResponse, error) {
+	var targets []model.RemoteWriteTarget
+	if err := s.db.Order("name").Find(&targets).Error; err != nil {
+		return nil, err
+	}
+	list := make([]model.RemoteWriteTargetResponse, 0, len(targets))
+	for i := range targets {
+		list = append(list, s.response(&targets[i]))
+	}
+	return list, nil
+}
+
+// Get returns a target with its delivery status
+func (s *RemoteWriteService) Get(id uuid.UUID) (*model.RemoteWriteTargetResponse, error) {
+	target, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	resp := s.response(target)
+	return &resp, nil
+}
+
+func (s *RemoteWriteService) find(id uuid.UUID) (*model.RemoteWriteTarget, error) {
+	var target model.RemoteWriteTarget
+	if err := s.db.First(&target, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRemoteWriteTargetNotFound
+		}
+		return nil, err
+	}
+	return &target, nil
+}
+
+func (s *RemoteWriteService) response(target *model.RemoteWriteTarget) model.RemoteWriteTargetResponse {
+	resp := target.Response()
+	s.mu.Lock()
+	if q, ok := s.queues[target.ID]; ok {
+		status := q.status
+		status.PendingSeries = len(q.pending)
+		resp.Status = &status
+	}
+	s.mu.Unlock()
+	return resp
+}
+
+// Create adds a target and starts sending to it when enabled
+func (s *RemoteWriteService) Create(userID uuid.UUID, req *model.CreateRemoteWriteTargetRequest) (*model.RemoteWriteTargetResponse, error) {
+	target := &model.RemoteWriteTarget{
+		CreatedBy:       userID,
+		Name:            strings.TrimSpace(req.Name),
+		URL:             strings.TrimSpace(req.URL),
+		Enabled:         req.Enabled == nil || *req.Enabled,
+		Username:        req.Username,
+		Password:        req.Password,
+		BearerToken:     req.BearerToken,
+		TenantID:        req.TenantID,
+		InsecureSkipTLS: req.InsecureSkipTLS,
+		BatchSize:       req.BatchSize,
+		FlushInterval:   req.FlushInterval,
+		MaxRetries:      defaultRemoteWriteRetries,
+	}
+	if req.MaxRetries != nil {
+		target.MaxRetries = *req.MaxRetries
+	}
+	if err := setRemoteWriteJSON(target, req.Headers, req.HostLabels, req.HostTags, req.Relabel); err != nil {
+		return nil, err
+	}
+	if err := validateRemoteWriteTarget(target); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(target).Error; err != nil {
+		return nil, err
+	}
+	if err := s.Reload(); err != nil {
+		s.logger.Error("failed to reload remote write targets", zap.Error(err))
+	}
+	resp := s.response(target)
+	return &resp, nil
+}
+
+// Update changes the given fields of a target
+func (s *RemoteWriteService) Update(id uuid.UUID, req *model.UpdateRemoteWriteTargetRequest) (*model.RemoteWriteTargetResponse, error) {
+	target, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	current := target.Response()
+	headers := map[string]string{}
+	if target.Headers != "" {
+		json.Unmarshal([]byte(target.Headers), &headers)
+	}
+	hostLabels, hostTags, relabel := current.HostLabels, current.HostTags, current.Relabel
+
+	if req.Name != nil {
+		target.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.URL != nil {
+		target.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.Enabled != nil {
+		target.Enabled = *req.Enabled
+	}
+	if req.Username != nil {
+		target.Username = *req.Username
+	}
+	if req.Password != nil {
+		target.Password = *req.Password
+	}
+	if req.BearerToken != nil {
+		target.BearerToken = *req.BearerToken
+	}
+	if req.TenantID != nil {
+		target.TenantID = *req.TenantID
+	}
+	if req.InsecureSkipTLS != nil {
+		target.InsecureSkipTLS = *req.InsecureSkipTLS
+	}
+	if req.Headers != nil {
+		headers = *req.Headers
+	}
+	if req.HostLabels != nil {
+		hostLabels = *req.HostLabels
+	}
+	if req.HostTags != nil {
+		hostTags = *req.HostTags
+	}
+	if req.Relabel != nil {
+		relabel = *req.Relabel
+	}
+	if req.BatchSize != nil {
+		target.BatchSize = *req.BatchSize
+	}
+	if req.FlushInterval != nil {
+		target.FlushInterval = *req.FlushInterval
+	}
+	if req.MaxRetries != nil {
+		target.MaxRetries = *req.MaxRetries
+	}
+	if err := setRemoteWriteJSON(target, headers, hostLabels, hostTags, relabel); err != nil {
+		return nil, err
+	}
+	if err := validateRemoteWriteTarget(target); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(target).Error; err != nil {
+		return nil, err
+	}
+	if err := s.Reload(); err != nil {
+		s.logger.Error("failed to reload remote write targets", zap.Error(err))
+	}
+	resp := s.response(target)
+	return &resp, nil
+}
+
+// Delete removes a target and discards the series waiting for it
+func (s *RemoteWriteService) Delete(id uuid.UUID) error {
+	result := s.db.Delete(&model.RemoteWriteTarget{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRemoteWriteTargetNotFound
+	}
+	return s.Reload()
+}
+
+// setRemoteWriteJSON stores the structured fields of a target as JSON
+func setRemoteWriteJSON(target *model.RemoteWriteTarget, headers, hostLabels map[string]string, hostTags []string, relabel []model.RelabelConfig) error {
+	if _, err := compileRelabel(relabel); err != nil {
+		return err
+	}
+	for _, v := range []struct {
+		field *string
+		value interface{}
+		empty bool
+	}{
+		{&target.Headers, headers, len(headers) == 0},
+		{&target.HostLabels, hostLabels, len(hostLabels) == 0},
+		{&target.HostTags, hostTags, len(hostTags) == 0},
+		{&target.Relabel, relabel, len(relabel) == 0},
+	} {
+		if v.empty {
+			*v.field = ""
+			continue
+		}
+		raw, err := json.Marshal(v.value)
+		if err != nil {
+			return err
+		}
+		*v.field = string(raw)
+	}
+	return nil
+}
+
+// validateRemoteWriteTarget checks a target and applies defaults to its batching
+func validateRemoteWriteTarget(target *model.RemoteWriteTarget) error {
+	if target.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRemoteWriteTarget)
+	}
+	if u, err := url.Parse(target.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an http(s) URL", ErrInvalidRemoteWriteTarget)
+	}
+	if target.BatchSize == 0 {
+		target.BatchSize = defaultRemoteWriteBatchSize
+	}
+	if target.FlushInterval == 0 {
+		target.FlushInterval = defaultRemoteWriteFlushInterval
+	}
+	switch {
+	case target.BatchSize < 1 || target.BatchSize > maxRemoteWriteBatchSize:
+		return fmt.Errorf("%w: batchSize must be between 1 and %d", ErrInvalidRemoteWriteTarget, maxRemoteWriteBatchSize)
+	case target.FlushInterval < 1 || target.FlushInterval > 3600:
+		return fmt.Errorf("%w: flushInterval must be between 1 and 3600 seconds", ErrInvalidRemoteWriteTarget)
+	case target.MaxRetries < 0 || target.MaxRetries > maxRemoteWriteRetries:
+		return fmt.Errorf("%w: maxRetries must be between 0 and %d", ErrInvalidRemoteWriteTarget, maxRemoteWriteRetries)
+	}
+	for name := range target.Response().HostLabels {
+		if name == "" {
+			return fmt.Errorf("%w: hostLabels must not have an empty name", ErrInvalidRemoteWriteTarget)
+		}
+	}
+	if target.Headers != "" {
+		if _, err := newRemoteWriteClient(target); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRemoteWriteTarget, err)
+		}
+	}
+	return nil
+}
+
+// Test sends one sample to a target and returns the error of the request
+func (s *RemoteWriteService) Test(ctx context.Context, id uuid.UUID) error {
+	target, err := s.find(id)
+	if err != nil {
+		return err
+	}
+	client, err := newRemoteWriteClient(target)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRemoteWriteTarget, err)
+	}
+	return client.Send(ctx, []remoteWriteSeries{{
+		Labels:  map[string]string{"__name__": "myops_remote_write_test", "job": "myops-agent", "target": target.Name},
+		Samples: []remoteWriteSample{{Value: 1, Timestamp: time.Now().UnixMilli()}},
+	}})
+}
+
+// ============== Ingestion ==============
+
+// Push queues the metrics of an agent report for every target whose host group
+// includes the host
+func (s *RemoteWriteService) Push(host *model.Host, metrics *model.HostMetricsReport, disks []model.HostDiskUsage, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queues) == 0 {
+		return
+	}
+
+	series := hostSeries(host, metrics, disks, at)
+	for _, q := range s.queues {
+		if !q.includes(host) {
+			continue
+		}
+		for _, one := range series {
+			labels, keep := relabelSeries(one.Labels, q.relabel)
+			if !keep {
+				continue
+			}
+			q.pending = append(q.pending, remoteWriteSeries{Labels: labels, Samples: one.Samples})
+		}
+		if limit := q.target.BatchSize * remoteWriteQueueBatches; len(q.pending) > limit {
+			dropped := len(q.pending) - limit
+			q.pending = append(q.pending[:0:0], q.pending[dropped:]...)
+			q.status.DroppedSeries += int64(dropped)
+		}
+	}
+}
+
+// includes reports whether the host is in the target's host group
+func (q *remoteWriteQueue) includes(host *model.Host) bool {
+	for name, value := range q.hostLabels {
+		if host.Labels[name] != value {
+			return false
+		}
+	}
+	if len(q.hostTags) == 0 {
+		return true
+	}
+	for _, want := range q.hostTags {
+		for _, tag := range host.Tags {
+			if tag == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hostSeries converts an agent report into series named like the node exporter's,
+// with the myops_host_ prefix
+func hostSeries(host *model.Host, metrics *model.HostMetricsReport, disks []model.HostDiskUsage, at time.Time) []remoteWriteSeries {
+	base := map[string]string{
+		"job":              "myops-agent",
+		"instance":         host.IPAddress,
+		"host":             host.Hostname,
+		"host_id":          host.ID.String(),
+		"__meta_host_tags": "," + strings.Join(host.Tags, ",") + ",",
+	}
+	for name, value := range host.Labels {
+		base["__meta_host_label_"+sanitizeLabelName(name)] = value
+	}
+	ts := at.UnixMilli()
+	var series []remoteWriteSeries
+	add := func(name string, value float64, extra ...string) {
+		labels := make(map[string]string, len(base)+1+len(extra)/2)
+		for k, v := range base {
+			labels[k] = v
+		}
+		labels["__name__"] = name
+		for i := 0; i+1 < len(extra); i += 2 {
+			labels[extra[i]] = extra[i+1]
+		}
+		series = append(series, remoteWriteSeries{Labels: labels, Samples: []remoteWriteSample{{Value: value, Timestamp: ts}}})
+	}
+
+	add("myops_host_up", 1)
+	if host.CPUCores != nil {
+		add("myops_host_cpu_cores", float64(*host.CPUCores))
+	}
+	if metrics != nil {
+		add("myops_host_cpu_usage_percent", metrics.CPUUsagePercent)
+		add("myops_host_load1", metrics.Load1)
+		add("myops_host_load5", metrics.Load5)
+		add("myops_host_load15", metrics.Load15)
+		add("myops_host_memory_used_bytes", float64(metrics.MemoryUsed))
+		add("myops_host_memory_available_bytes", float64(metrics.MemoryAvailable))
+		add("myops_host_swap_used_bytes", float64(metrics.SwapUsed))
+		add("myops_host_uptime_seconds", float64(metrics.UptimeSeconds))
+		for _, n := range metrics.Networks {
+			add("myops_host_network_receive_bytes_total", float64(n.BytesRecv), "device", n.Name)
+			add("myops_host_network_transmit_bytes_total", float64(n.BytesSent), "device", n.Name)
+		}
+	}
+	for _, d := range disks {
+		extra := []string{"device", d.Device, "mountpoint", d.MountPoint, "fstype", d.FileSystem}
+		add("myops_host_disk_size_bytes", float64(d.Total), extra...)
+		add("myops_host_disk_used_bytes", float64(d.Used), extra...)
+		add("myops_host_disk_free_bytes", float64(d.Free), extra...)
+	}
+	return series
+}
+
+// sanitizeLabelName replaces the characters label names may not contain
+func sanitizeLabelName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// relabelSeries applies relabel configs to a copy of labels as Prometheus does, then
+// removes the labels starting with __ other than __name__. It reports false when the
+// series is dropped.
+func relabelSeries(in map[string]string, configs []compiledRelabel) (map[string]string, bool) {
+	labels := make(map[string]string, len(in))
+	for k, v := range in {
+		labels[k] = v
+	}
+	for _, c := range configs {
+		values := make([]string, len(c.SourceLabels))
+		for i, name := range c.SourceLabels {
+			values[i] = labels[name]
+		}
+		value := strings.Join(values, c.Separator)
+
+		switch c.Action {
+		case model.RelabelReplace:
+			match := c.regex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			target := string(c.regex.ExpandString(nil, c.TargetLabel, value, match))
+			result := string(c.regex.ExpandString(nil, c.Replacement, value, match))
+			if !prometheusLabelName.MatchString(target) {
+				continue
+			}
+			if result == "" {
+				delete(labels, target)
+			} else {
+				labels[target] = result
+			}
+		case model.RelabelKeep:
+			if !c.regex.MatchString(value) {
+				return nil, false
+			}
+		case model.RelabelDrop:
+			if c.regex.MatchString(value) {
+				return nil, false
+			}
+		case model.RelabelLabelMap:
+			for name, v := range labels {
+				if match := c.regex.FindStringSubmatchIndex(name); match != nil {
+					labels[string(c.regex.ExpandString(nil, c.Replacement, name, match))] = v
+				}
+			}
+		case model.RelabelLabelDrop:
+			for name := range labels {
+				if c.regex.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+		case model.RelabelLabelKeep:
+			for name := range labels {
+				if !c.regex.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+		}
+	}
+
+	for name, value := range labels {
+		if value == "" || (strings.HasPrefix(name, "__") && name != "__name__") {
+			delete(labels, name)
+		}
+	}
+	if labels["__name__"] == "" {
+		return nil, false
+	}
+	return labels, true
+}
+
+// ============== Delivery ==============
+
+// Run loads the targets, then flushes due batches until ctx is done
+func (s *RemoteWriteService) Run(ctx context.Context) {
+	if err := s.Reload(); err != nil {
+		s.logger.Error("failed to load remote write targets", zap.Error(err))
+	}
+	ticker := time.NewTicker(remoteWriteTick)
+	defer ticker.Stop()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for _, q := range s.queues {
+				due := len(q.pending) >= q.target.BatchSize ||
+					(len(q.pending) > 0 && now.Sub(q.lastFlush) >= time.Duration(q.target.FlushInterval)*time.Second)
+				if q.sending || !due {
+					continue
+				}
+				q.sending = true
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					s.flush(ctx, q)
+				}()
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// flush sends the queue's pending series in batches. A batch that keeps failing
+// after the target's retries, or that the endpoint rejects, is discarded.
+func (s *RemoteWriteService) flush(ctx context.Context, q *remoteWriteQueue) {
+	defer func() {
+		s.mu.Lock()
+		q.sending = false
+		q.lastFlush = time.Now()
+		s.mu.Unlock()
+	}()
+
+	for {
+		s.mu.Lock()
+		n := min(len(q.pending), q.target.BatchSize)
+		batch := q.pending[:n:n]
+		q.pending = q.pending[n:]
+		s.mu.Unlock()
+		if n == 0 {
+			return
+		}
+
+		err := s.sendWithRetries(ctx, q, batch)
+		now := time.Now()
+		s.mu.Lock()
+		if err == nil {
+			q.status.SentSeries += int64(n)
+			q.status.LastSentAt = &now
+		} else {
+			q.status.FailedBatches++
+			q.status.LastError = err.Error()
+			q.status.LastErrorAt = &now
+		}
+		s.mu.Unlock()
+		if err != nil {
+			s.logger.Warn("remote write batch failed",
+				zap.String("target", q.target.Name),
+				zap.Int("series", n),
+				zap.Error(err),
+			)
+			return
+		}
+		if ctx.Err() != nil || n < q.target.BatchSize {
+			return
+		}
+	}
+}
+
+// sendWithRetries sends a batch, retrying retryable failures with exponential backoff
+func (s *RemoteWriteService) sendWithRetries(ctx context.Context, q *remoteWriteQueue, batch []remoteWriteSeries) error {
+	backoff := remoteWriteRetryBase
+	for attempt := 0; ; attempt++ {
+		err := q.client.Send(ctx, batch)
+		var writeErr *remoteWriteError
+		if err == nil || attempt >= q.target.MaxRetries || !errors.As(err, &writeErr) || !writeErr.Retry {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, remoteWriteRetryMax)
+	}
+}
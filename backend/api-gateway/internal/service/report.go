@@ -0,0 +1,809 @@
+// Package service provides business logic for scheduled reports
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// JobTypeReportGenerate is the job that generates and delivers a pending report
+const JobTypeReportGenerate = "report.generate"
+
+// Report settings
+const (
+	reportScheduleInterval = time.Minute
+	reportPruneInterval    = time.Hour
+	defaultReportWindow    = 7 * 24 * 3600
+	minReportWindow        = 3600
+	maxReportWindow        = 366 * 24 * 3600
+	reportTopAnomalies     = 10
+)
+
+var (
+	// ErrReportNotFound is returned for reports that do not exist
+	ErrReportNotFound = errors.New("report not found")
+	// ErrReportNotReady is returned when downloading a report that was not generated
+	ErrReportNotReady = errors.New("report is not ready")
+	// ErrReportScheduleNotFound is returned for schedules that do not exist
+	ErrReportScheduleNotFound = errors.New("report schedule not found")
+	// ErrInvalidReport is returned for invalid schedules and report requests
+	ErrInvalidReport = errors.New("invalid report")
+)
+
+// reportJob is the payload of a report.generate job
+type reportJob struct {
+	ReportID uuid.UUID `json:"reportId"`
+}
+
+// ReportService generates reports from templates, on cron schedules or on
+// request, archives them and delivers them to their recipients
+type ReportService struct {
+	db            *gorm.DB
+	logger        *zap.Logger
+	settings      *SettingsService
+	jobs          *JobQueue
+	notifications *NotificationService
+	events        *EventBus
+}
+
+// NewReportService creates a new report service and registers the report
+// generation job with the queue
+func NewReportService(db *gorm.DB, logger *zap.Logger, settings *SettingsService, jobs *JobQueue) *ReportService {
+	s := &ReportService{db: db, logger: logger, settings: settings, jobs: jobs, notifications: NewNotificationService(db, logger)}
+	jobs.Register(JobTypeReportGenerate, s.generateJob, JobTypeOptions{MaxAttempts: 3, VisibilityTimeout: 10 * time.Minute})
+	return s
+}
+
+// SetEventBus sets the bus report.generated events are published on
+func (s *ReportService) SetEventBus(events *EventBus) {
+	s.events = events
+	s.notifications.SetEventBus(events)
+}
+
+// Templates lists the templates reports are generated from
+func (s *ReportService) Templates() []model.ReportTemplate {
+	return model.ReportTemplates
+}
+
+// ============== Archive ==============
+
+// Generate queues a report covering the window before now. The report is
+// pending until the job queue has generated it.
+func (s *ReportService) Generate(userID uuid.UUID, req *model.GenerateReportRequest) (*model.ReportResponse, error) {
+	if req.Format == "" {
+		req.Format = model.ReportFormatPDF
+	}
+	if req.Window == 0 {
+		req.Window = defaultReportWindow
+	}
+	if len(req.Recipients) == 0 {
+		req.Recipients = []uuid.UUID{userID}
+	}
+	if err := validateReport(req.Template, req.Format, req.Window); err != nil {
+		return nil, err
+	}
+	if err := s.checkRecipients(req.Recipients); err != nil {
+		return nil, err
+	}
+
+	report, err := s.queue(nil, &userID, req.Template, req.Format, req.Window, req.Recipients, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	resp := report.Response()
+	return &resp, nil
+}
+
+// queue archives a pending report and enqueues its generation
+func (s *ReportService) queue(scheduleID, triggeredBy *uuid.UUID, templateName string, format model.ReportFormat, window int, recipients []uuid.UUID, end time.Time) (*model.Report, error) {
+	template, _ := model.LookupReportTemplate(templateName)
+	start := end.Add(-time.Duration(window) * time.Second)
+	recipientData, _ := json.Marshal(recipients)
+	report := &model.Report{
+		ScheduleID:  scheduleID,
+		TriggeredBy: triggeredBy,
+		Title:       fmt.Sprintf("%s %s - %s", template.Title, start.UTC().Format("2006-01-02"), end.UTC().Format("2006-01-02")),
+		Template:    template.Name,
+		Format:      format,
+		Recipients:  string(recipientData),
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Status:      model.ReportStatusPending,
+	}
+	if err := s.db.Create(report).Error; err != nil {
+		return nil, err
+	}
+	if _, err := s.jobs.Enqueue(JobTypeReportGenerate, reportJob{ReportID: report.ID}, JobOptions{}); err != nil {
+		s.db.Delete(&model.Report{}, "id = ?", report.ID)
+		return nil, err
+	}
+	return report, nil
+}
+
+// Reports lists archived reports, newest first, without their data
+func (s *ReportService) Reports(filter *model.ReportFilter) ([]model.Report, int64, error) {
+	query := s.db.Model(&model.Report{})
+	if filter.ScheduleID != nil {
+		query = query.Where("schedule_id = ?", *filter.ScheduleID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at <= ?", filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var reports []model.Report
+	if err := query.Omit("data").Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&reports).Error; err != nil {
+		return nil, 0, err
+	}
+	return reports, total, nil
+}
+
+// Report gets an archived report with its data
+func (s *ReportService) Report(id uuid.UUID) (*model.ReportResponse, error) {
+	var report model.Report
+	if err := s.db.First(&report, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReportNotFound
+		}
+		return nil, err
+	}
+	resp := report.Response()
+	return &resp, nil
+}
+
+// DeleteReport removes a report from the archive
+func (s *ReportService) DeleteReport(id uuid.UUID) error {
+	result := s.db.Delete(&model.Report{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReportNotFound
+	}
+	return nil
+}
+
+// Prune deletes reports older than the retention setting and returns the number deleted
+func (s *ReportService) Prune() (int64, error) {
+	retention := s.settings.Duration(model.SettingReportRetention)
+	if retention <= 0 {
+		return 0, nil
+	}
+	result := s.db.Where("created_at < ?", time.Now().Add(-retention)).Delete(&model.Report{})
+	return result.RowsAffected, result.Error
+}
+
+// ============== Schedules ==============
+
+// ListSchedules lists the report schedules
+func (s *ReportService) ListSchedules() ([]model.ReportScheduleResponse, error) {
+	var schedules []model.ReportSchedule
+	if err := s.db.Order("name").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	resp := make([]model.ReportScheduleResponse, len(schedules))
+	for i := range schedules {
+		resp[i] = schedules[i].Response()
+	}
+	return resp, nil
+}
+
+// GetSchedule gets a report schedule
+func (s *ReportService) GetSchedule(id uuid.UUID) (*model.ReportScheduleResponse, error) {
+	schedule, err := s.findSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	resp := schedule.Response()
+	return &resp, nil
+}
+
+func (s *ReportService) findSchedule(id uuid.UUID) (*model.ReportSchedule, error) {
+	var schedule model.ReportSchedule
+	if err := s.db.First(&schedule, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReportScheduleNotFound
+		}
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// CreateSchedule adds a schedule whose first report is generated at the
+// schedule's next time
+func (s *ReportService) CreateSchedule(userID uuid.UUID, req *model.CreateReportScheduleRequest) (*model.ReportScheduleResponse, error) {
+	schedule := &model.ReportSchedule{
+		Name:      strings.TrimSpace(req.Name),
+		Template:  req.Template,
+		Format:    req.Format,
+		Schedule:  strings.TrimSpace(req.Schedule),
+		Window:    req.Window,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+		CreatedBy: userID,
+	}
+	if schedule.Format == "" {
+		schedule.Format = model.ReportFormatPDF
+	}
+	if schedule.Window == 0 {
+		schedule.Window = defaultReportWindow
+	}
+	if err := s.setScheduleRecipients(schedule, req.Recipients); err != nil {
+		return nil, err
+	}
+	if err := s.planSchedule(schedule, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(schedule).Error; err != nil {
+		return nil, err
+	}
+	resp := schedule.Response()
+	return &resp, nil
+}
+
+// UpdateSchedule changes the given fields of a schedule and plans its next run
+func (s *ReportService) UpdateSchedule(id uuid.UUID, req *model.UpdateReportScheduleRequest) (*model.ReportScheduleResponse, error) {
+	schedule, err := s.findSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		schedule.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Template != nil {
+		schedule.Template = *req.Template
+	}
+	if req.Format != nil {
+		schedule.Format = *req.Format
+	}
+	if req.Schedule != nil {
+		schedule.Schedule = strings.TrimSpace(*req.Schedule)
+	}
+	if req.Window != nil {
+		schedule.Window = *req.Window
+	}
+	if req.Recipients != nil {
+		if err := s.setScheduleRecipients(schedule, *req.Recipients); err != nil {
+			return nil, err
+		}
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+	if err := s.planSchedule(schedule, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(schedule).Error; err != nil {
+		return nil, err
+	}
+	resp := schedule.Response()
+	return &resp, nil
+}
+
+// DeleteSchedule removes a schedule; its reports are kept
+func (s *ReportService) DeleteSchedule(id uuid.UUID) error {
+	result := s.db.Delete(&model.ReportSchedule{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReportScheduleNotFound
+	}
+	return nil
+}
+
+// RunSchedule queues a report of a schedule now, without moving its next run
+func (s *ReportService) RunSchedule(userID, id uuid.UUID) (*model.ReportResponse, error) {
+	schedule, err := s.findSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	report, err := s.queue(&schedule.ID, &userID, schedule.Template, schedule.Format, schedule.Window, scheduleRecipients(schedule), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	resp := report.Response()
+	return &resp, nil
+}
+
+// setScheduleRecipients checks the recipients exist and stores them as JSON
+func (s *ReportService) setScheduleRecipients(schedule *model.ReportSchedule, ids []uuid.UUID) error {
+	if err := s.checkRecipients(ids); err != nil {
+		return err
+	}
+	schedule.Recipients = ""
+	if len(ids) > 0 {
+		data, _ := json.Marshal(ids)
+		schedule.Recipients = string(data)
+	}
+	return nil
+}
+
+func (s *ReportService) checkRecipients(ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var found int64
+	if err := s.db.Model(&model.User{}).Where("id IN ?", ids).Count(&found).Error; err != nil {
+		return err
+	}
+	if int(found) != len(uniqueUUIDs(ids)) {
+		return fmt.Errorf("%w: unknown recipient", ErrInvalidReport)
+	}
+	return nil
+}
+
+// planSchedule validates a schedule and sets its next run after from, or
+// clears it when the schedule is disabled
+func (s *ReportService) planSchedule(schedule *model.ReportSchedule, from time.Time) error {
+	if schedule.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidReport)
+	}
+	if err := validateReport(schedule.Template, schedule.Format, schedule.Window); err != nil {
+		return err
+	}
+	if strings.TrimSpace(schedule.Schedule) == "@reboot" {
+		return fmt.Errorf("%w: schedule must have calendar times", ErrInvalidReport)
+	}
+	next, err := NextCronExecutions(schedule.Schedule, from, 1)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidReport, err)
+	}
+	schedule.NextRunAt = nil
+	if schedule.Enabled && len(next) > 0 {
+		schedule.NextRunAt = &next[0]
+	}
+	return nil
+}
+
+func validateReport(templateName string, format model.ReportFormat, window int) error {
+	if _, ok := model.LookupReportTemplate(templateName); !ok {
+		return fmt.Errorf("%w: unknown template %q", ErrInvalidReport, templateName)
+	}
+	if format != model.ReportFormatPDF && format != model.ReportFormatCSV {
+		return fmt.Errorf("%w: format must be pdf or csv", ErrInvalidReport)
+	}
+	if window < minReportWindow || window > maxReportWindow {
+		return fmt.Errorf("%w: window must be between %d and %d seconds", ErrInvalidReport, minReportWindow, maxReportWindow)
+	}
+	return nil
+}
+
+// scheduleRecipients returns who a schedule's reports are delivered to
+func scheduleRecipients(schedule *model.ReportSchedule) []uuid.UUID {
+	recipients := schedule.Response().Recipients
+	if len(recipients) == 0 {
+		recipients = []uuid.UUID{schedule.CreatedBy}
+	}
+	return recipients
+}
+
+func uniqueUUIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	var unique []uuid.UUID
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// ============== Scheduled Reports ==============
+
+// Run queues the reports of due schedules every minute and prunes expired
+// reports every hour until ctx is done
+func (s *ReportService) Run(ctx context.Context) {
+	ticker := time.NewTicker(reportScheduleInterval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		s.runDue()
+		if time.Since(lastPrune) >= reportPruneInterval {
+			lastPrune = time.Now()
+			if deleted, err := s.Prune(); err != nil {
+				s.logger.Error("failed to prune reports", zap.Error(err))
+			} else if deleted > 0 {
+				s.logger.Info("pruned reports", zap.Int64("deleted", deleted))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDue queues a report of every enabled schedule whose next run has come. A
+// schedule is claimed by moving its next run, so each report is queued once
+// even with several gateway replicas. Runs missed while the gateway was down
+// are not caught up.
+func (s *ReportService) runDue() {
+	now := time.Now()
+	var due []model.ReportSchedule
+	if err := s.db.Where("enabled = ? AND next_run_at <= ?", true, now).Find(&due).Error; err != nil {
+		s.logger.Error("failed to load report schedules", zap.Error(err))
+		return
+	}
+
+	for i := range due {
+		schedule := &due[i]
+		updates := map[string]interface{}{"last_run_at": now, "next_run_at": nil}
+		if next, err := NextCronExecutions(schedule.Schedule, now, 1); err == nil && len(next) > 0 {
+			updates["next_run_at"] = next[0]
+		}
+		claim := s.db.Model(&model.ReportSchedule{}).
+			Where("id = ? AND next_run_at = ?", schedule.ID, *schedule.NextRunAt).
+			Updates(updates)
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+
+		// The report covers the window up to the scheduled time, not the minute it was noticed
+		if _, err := s.queue(&schedule.ID, nil, schedule.Template, schedule.Format, schedule.Window, scheduleRecipients(schedule), *schedule.NextRunAt); err != nil {
+			s.logger.Error("failed to queue scheduled report", zap.String("schedule", schedule.Name), zap.Error(err))
+		}
+	}
+}
+
+// ============== Generation ==============
+
+// generateJob collects the data of a pending report and delivers it. A report
+// whose last attempt fails is archived as failed and its recipients are told.
+func (s *ReportService) generateJob(ctx context.Context, job *model.Job) error {
+	var payload reportJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	var report model.Report
+	if err := s.db.First(&report, "id = ?", payload.ReportID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // Deleted while queued
+		}
+		return err
+	}
+	if report.Status != model.ReportStatusPending {
+		return nil
+	}
+
+	data, err := s.collect(ctx, &report)
+	if err != nil {
+		if job.Attempts >= job.MaxAttempts {
+			s.finish(&report, nil, err)
+		}
+		return err
+	}
+	return s.finish(&report, data, nil)
+}
+
+// finish archives a report's data or the error it failed with and delivers it
+func (s *ReportService) finish(report *model.Report, data *model.ReportData, failure error) error {
+	now := time.Now()
+	updates := map[string]interface{}{"completed_at": now}
+	if failure != nil {
+		updates["status"] = model.ReportStatusFailed
+		updates["error"] = failure.Error()
+	} else {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		updates["status"] = model.ReportStatusCompleted
+		updates["data"] = string(encoded)
+	}
+	if err := s.db.Model(&model.Report{}).Where("id = ? AND status = ?", report.ID, model.ReportStatusPending).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	report.CompletedAt = &now
+	report.Status = updates["status"].(model.ReportStatus)
+	if failure != nil {
+		report.Error = failure.Error()
+	}
+	s.deliver(report, data)
+	return nil
+}
+
+// deliver notifies the report's recipients and publishes report.generated for
+// each of them, so their webhooks receive it too
+func (s *ReportService) deliver(report *model.Report, data *model.ReportData) {
+	var recipients []uuid.UUID
+	if report.Recipients != "" {
+		json.Unmarshal([]byte(report.Recipients), &recipients)
+	}
+
+	title := report.Title
+	message := fmt.Sprintf("Download: /api/v1/reports/%s/download", report.ID)
+	priority := model.NotificationPriorityLow
+	if report.Status == model.ReportStatusFailed {
+		title = "Failed to generate " + report.Title
+		message = report.Error
+		priority = model.NotificationPriorityMedium
+	} else if summary := summarizeReport(data); summary != "" {
+		message = summary + ". " + message
+	}
+
+	attrs := map[string]string{
+		"reportId": report.ID.String(),
+		"template": report.Template,
+		"status":   string(report.Status),
+	}
+	if report.ScheduleID != nil {
+		attrs["scheduleId"] = report.ScheduleID.String()
+	}
+	for _, userID := range uniqueUUIDs(recipients) {
+		if _, err := s.notifications.CreateSourcedNotification(userID, model.NotificationSourceReports, model.NotificationTypeInfo, title, message, priority); err != nil {
+			s.logger.Error("failed to notify report recipient", zap.String("reportId", report.ID.String()), zap.Error(err))
+		}
+		s.events.Publish(userID, model.EventReportGenerated, attrs, report)
+	}
+}
+
+// summarizeReport is the one-line summary of a report sent with its notification
+func summarizeReport(data *model.ReportData) string {
+	if data == nil {
+		return ""
+	}
+	var parts []string
+	if len(data.HostAvailability) > 0 {
+		var sum float64
+		for _, h := range data.HostAvailability {
+			sum += h.Availability
+		}
+		parts = append(parts, fmt.Sprintf("%d hosts, %.2f%% average availability", len(data.HostAvailability), sum/float64(len(data.HostAvailability))))
+	}
+	if len(data.AlertSummary) > 0 {
+		var fired int64
+		for _, c := range data.AlertSummary {
+			fired += c.Fired
+		}
+		parts = append(parts, fmt.Sprintf("%d alerts fired", fired))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// collect gathers the data of the sections of a report's template
+func (s *ReportService) collect(ctx context.Context, report *model.Report) (*model.ReportData, error) {
+	template, ok := model.LookupReportTemplate(report.Template)
+	if !ok {
+		return nil, fmt.Errorf("unknown template %q", report.Template)
+	}
+	db := s.db.WithContext(ctx)
+	start, end := report.PeriodStart, report.PeriodEnd
+
+	data := &model.ReportData{Sections: template.Sections}
+	var err error
+	for _, section := range template.Sections {
+		switch section {
+		case model.ReportSectionHostAvailability:
+			data.HostAvailability, err = hostAvailability(db, start, end)
+		case model.ReportSectionAlertSummary:
+			data.AlertSummary, err = alertSummary(db, start, end)
+		case model.ReportSectionTopAnomalies:
+			data.TopAnomalies, err = topAnomalies(db, start, end)
+		case model.ReportSectionClusterCapacity:
+			data.ClusterCapacity, err = clusterCapacity(db, start, end)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", section, err)
+		}
+	}
+	return data, nil
+}
+
+// hostAvailability computes how long each host was offline in the period from
+// the host_down and host_up events the heartbeat monitor records, least
+// available first. Hosts registered during the period count from registration;
+// retired hosts are left out.
+func hostAvailability(db *gorm.DB, start, end time.Time) ([]model.ReportHostAvailability, error) {
+	var hosts []model.Host
+	if err := db.Select("id, hostname, status, created_at").
+		Where("status IN ?", []model.HostStatus{model.HostStatusApproved, model.HostStatusOnline, model.HostStatusDegraded, model.HostStatusOffline}).
+		Where("lifecycle <> ?", model.HostLifecycleRetired).
+		Where("created_at < ?", end).
+		Find(&hosts).Error; err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return []model.ReportHostAvailability{}, nil
+	}
+	ids := make([]uuid.UUID, len(hosts))
+	for i, h := range hosts {
+		ids[i] = h.ID
+	}
+	kinds := []string{"host_down", "host_up"}
+
+	// Whether each host was down when the period began
+	var before []model.Event
+	if err := db.Raw(`SELECT e.host_id, e.type FROM events e
+		JOIN (SELECT host_id, MAX(created_at) AS created_at FROM events
+			WHERE type IN ? AND host_id IN ? AND created_at < ? GROUP BY host_id) last
+		ON last.host_id = e.host_id AND last.created_at = e.created_at
+		WHERE e.type IN ?`, kinds, ids, start, kinds).Scan(&before).Error; err != nil {
+		return nil, err
+	}
+	downAtStart := make(map[uuid.UUID]bool)
+	for _, e := range before {
+		if e.HostID != nil {
+			downAtStart[*e.HostID] = e.Type == "host_down"
+		}
+	}
+
+	var events []model.Event
+	if err := db.Select("host_id, type, created_at").
+		Where("type IN ? AND host_id IN ? AND created_at >= ? AND created_at < ?", kinds, ids, start, end).
+		Order("created_at").
+		Find(&events).Error; err != nil {
+		return nil, err
+	}
+	byHost := make(map[uuid.UUID][]model.Event)
+	for _, e := range events {
+		if e.HostID != nil {
+			byHost[*e.HostID] = append(byHost[*e.HostID], e)
+		}
+	}
+
+	availability := make([]model.ReportHostAvailability, 0, len(hosts))
+	for _, h := range hosts {
+		from := start
+		if h.CreatedAt.After(from) {
+			from = h.CreatedAt
+		}
+		row := model.ReportHostAvailability{HostID: h.ID, Hostname: h.Hostname, Status: h.Status, Availability: 100}
+
+		down, downSince := downAtStart[h.ID], from
+		if down {
+			row.Outages++
+		}
+		var downtime time.Duration
+		for _, e := range byHost[h.ID] {
+			switch {
+			case e.Type == "host_down" && !down:
+				down, downSince = true, e.CreatedAt
+				row.Outages++
+			case e.Type == "host_up" && down:
+				down = false
+				downtime += e.CreatedAt.Sub(downSince)
+			}
+		}
+		if down {
+			downtime += end.Sub(downSince)
+		}
+
+		row.DowntimeSeconds = int64(downtime.Seconds())
+		if period := end.Sub(from); period > 0 {
+			row.Availability = 100 * (1 - downtime.Seconds()/period.Seconds())
+		}
+		availability = append(availability, row)
+	}
+	sort.Slice(availability, func(i, j int) bool {
+		if availability[i].Availability != availability[j].Availability {
+			return availability[i].Availability < availability[j].Availability
+		}
+		return availability[i].Hostname < availability[j].Hostname
+	})
+	return availability, nil
+}
+
+// alertSummary counts the alerts that fired in the period by severity, most
+// severe first, with every severity present
+func alertSummary(db *gorm.DB, start, end time.Time) ([]model.ReportAlertCount, error) {
+	var rows []model.ReportAlertCount
+	if err := db.Model(&model.Alert{}).
+		Select("severity, COUNT(*) AS fired, SUM(CASE WHEN resolved_at IS NOT NULL AND resolved_at < ? THEN 1 ELSE 0 END) AS resolved", end).
+		Where("started_at >= ? AND started_at < ?", start, end).
+		Group("severity").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[model.AlertSeverity]model.ReportAlertCount, len(rows))
+	for _, row := range rows {
+		counts[row.Severity] = row
+	}
+
+	summary := []model.ReportAlertCount{}
+	for _, severity := range []model.AlertSeverity{model.AlertSeverityCritical, model.AlertSeverityWarning, model.AlertSeverityInfo} {
+		row := counts[severity]
+		row.Severity = severity
+		summary = append(summary, row)
+		delete(counts, severity)
+	}
+	for _, row := range counts {
+		summary = append(summary, row)
+	}
+	return summary, nil
+}
+
+// topAnomalies returns the anomalies detected in the period, most severe and
+// then furthest from the expected value first
+func topAnomalies(db *gorm.DB, start, end time.Time) ([]model.ReportAnomaly, error) {
+	var events []model.AnomalyEvent
+	if err := db.Where("created_at >= ? AND created_at < ?", start, end).
+		Order("CASE severity WHEN 'critical' THEN 0 WHEN 'warning' THEN 1 ELSE 2 END, ABS(deviation) DESC").
+		Limit(reportTopAnomalies).
+		Find(&events).Error; err != nil {
+		return nil, err
+	}
+	anomalies := make([]model.ReportAnomaly, len(events))
+	for i, e := range events {
+		anomalies[i] = model.ReportAnomaly{
+			ID:           e.ID,
+			Severity:     e.Severity,
+			MetricName:   e.MetricName,
+			HostID:       e.HostID,
+			ClusterID:    e.ClusterID,
+			CurrentValue: e.CurrentValue,
+			Deviation:    e.Deviation,
+			Description:  e.Description,
+			DetectedAt:   e.CreatedAt,
+		}
+	}
+	return anomalies, nil
+}
+
+// clusterCapacity summarizes the CPU and memory use of every cluster with
+// metric snapshots in the period, busiest first
+func clusterCapacity(db *gorm.DB, start, end time.Time) ([]model.ReportClusterCapacity, error) {
+	var rows []model.ReportClusterCapacity
+	if err := db.Model(&model.ClusterMetric{}).
+		Select(`cluster_id, COUNT(*) AS samples,
+			AVG(cpu_usage_percent) AS avg_cpu_percent, MAX(cpu_usage_percent) AS max_cpu_percent,
+			AVG(CASE WHEN memory_total_bytes > 0 THEN 100.0 * memory_usage_bytes / memory_total_bytes END) AS avg_memory_percent,
+			MAX(CASE WHEN memory_total_bytes > 0 THEN 100.0 * memory_usage_bytes / memory_total_bytes END) AS max_memory_percent`).
+		Where("timestamp >= ? AND timestamp < ?", start.Unix(), end.Unix()).
+		Group("cluster_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	capacity := make([]model.ReportClusterCapacity, 0, len(rows))
+	for _, row := range rows {
+		var cluster model.K8sCluster
+		if err := db.Select("id, name").First(&cluster, "id = ?", row.ClusterID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue // Deleted since
+			}
+			return nil, err
+		}
+		row.Name = cluster.Name
+
+		var last []model.ClusterMetric
+		if err := db.Select("node_count, pod_count").
+			Where("cluster_id = ? AND timestamp < ?", row.ClusterID, end.Unix()).
+			Order("timestamp DESC").Limit(1).Find(&last).Error; err != nil {
+			return nil, err
+		}
+		if len(last) > 0 {
+			row.Nodes, row.Pods = last[0].NodeCount, last[0].PodCount
+		}
+		capacity = append(capacity, row)
+	}
+	sort.Slice(capacity, func(i, j int) bool {
+		if capacity[i].AvgCPUPercent != capacity[j].AvgCPUPercent {
+			return capacity[i].AvgCPUPercent > capacity[j].AvgCPUPercent
+		}
+		return capacity[i].Name < capacity[j].Name
+	})
+	return capacity, nil
+}
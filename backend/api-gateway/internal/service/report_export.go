@@ -0,0 +1,137 @@
+// Package service provides CSV and PDF renderings of generated reports
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// ExportReport renders a completed report in a format
+func ExportReport(report *model.ReportResponse, format model.ReportFormat) ([]byte, error) {
+	if report.Status != model.ReportStatusCompleted || report.Data == nil {
+		return nil, ErrReportNotReady
+	}
+	switch format {
+	case model.ReportFormatCSV:
+		return ExportReportCSV(report)
+	case model.ReportFormatPDF:
+		return ExportReportPDF(report), nil
+	}
+	return nil, fmt.Errorf("%w: format must be pdf or csv", ErrInvalidReport)
+}
+
+// ExportReportCSV writes each section of a report as a table with its own
+// header row, separated by an empty line
+func ExportReportCSV(report *model.ReportResponse) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	formatFloat := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+	for i, section := range report.Data.Sections {
+		if i > 0 {
+			w.Write([]string{})
+		}
+		switch section {
+		case model.ReportSectionHostAvailability:
+			w.Write([]string{"host", "status", "outages", "downtime_seconds", "availability_percent"})
+			for _, h := range report.Data.HostAvailability {
+				w.Write([]string{h.Hostname, string(h.Status), strconv.Itoa(h.Outages), strconv.FormatInt(h.DowntimeSeconds, 10), formatFloat(h.Availability)})
+			}
+		case model.ReportSectionAlertSummary:
+			w.Write([]string{"severity", "fired", "resolved"})
+			for _, c := range report.Data.AlertSummary {
+				w.Write([]string{string(c.Severity), strconv.FormatInt(c.Fired, 10), strconv.FormatInt(c.Resolved, 10)})
+			}
+		case model.ReportSectionTopAnomalies:
+			w.Write([]string{"detected_at", "severity", "metric", "host_id", "cluster_id", "value", "deviation", "description"})
+			for _, a := range report.Data.TopAnomalies {
+				w.Write([]string{a.DetectedAt.UTC().Format(time.RFC3339), a.Severity, a.MetricName, optionalUUID(a.HostID), optionalUUID(a.ClusterID),
+					formatFloat(a.CurrentValue), formatFloat(a.Deviation), a.Description})
+			}
+		case model.ReportSectionClusterCapacity:
+			w.Write([]string{"cluster", "samples", "avg_cpu_percent", "max_cpu_percent", "avg_memory_percent", "max_memory_percent", "nodes", "pods"})
+			for _, c := range report.Data.ClusterCapacity {
+				w.Write([]string{c.Name, strconv.FormatInt(c.Samples, 10), formatFloat(c.AvgCPUPercent), formatFloat(c.MaxCPUPercent),
+					formatFloat(c.AvgMemoryPercent), formatFloat(c.MaxMemoryPercent), strconv.Itoa(int(c.Nodes)), strconv.Itoa(int(c.Pods))})
+			}
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// ExportReportPDF renders a report as a plain text PDF
+func ExportReportPDF(report *model.ReportResponse) []byte {
+	lines := []string{
+		report.Title,
+		fmt.Sprintf("Period: %s to %s", report.PeriodStart.UTC().Format(time.RFC3339), report.PeriodEnd.UTC().Format(time.RFC3339)),
+	}
+	if report.CompletedAt != nil {
+		lines = append(lines, fmt.Sprintf("Generated at %s", report.CompletedAt.UTC().Format(time.RFC3339)))
+	}
+
+	for _, section := range report.Data.Sections {
+		lines = append(lines, "")
+		switch section {
+		case model.ReportSectionHostAvailability:
+			lines = append(lines, "Host availability", "")
+			if len(report.Data.HostAvailability) == 0 {
+				lines = append(lines, "No hosts")
+			}
+			for _, h := range report.Data.HostAvailability {
+				lines = append(lines, fmt.Sprintf("%-40s %8.2f%%  %d outages, %s down",
+					truncatePDFField(h.Hostname, 40), h.Availability, h.Outages, time.Duration(h.DowntimeSeconds)*time.Second))
+			}
+		case model.ReportSectionAlertSummary:
+			lines = append(lines, "Alerts by severity", "")
+			for _, c := range report.Data.AlertSummary {
+				lines = append(lines, fmt.Sprintf("%-10s %6d fired, %6d resolved", c.Severity, c.Fired, c.Resolved))
+			}
+		case model.ReportSectionTopAnomalies:
+			lines = append(lines, "Top anomalies", "")
+			if len(report.Data.TopAnomalies) == 0 {
+				lines = append(lines, "No anomalies")
+			}
+			for _, a := range report.Data.TopAnomalies {
+				lines = append(lines, wrapPDFText(fmt.Sprintf("[%s] %s %s = %.2f (%.1f sigma)",
+					a.Severity, a.DetectedAt.UTC().Format("2006-01-02 15:04"), a.MetricName, a.CurrentValue, a.Deviation), "")...)
+				if a.Description != "" {
+					lines = append(lines, wrapPDFText(a.Description, "    ")...)
+				}
+			}
+		case model.ReportSectionClusterCapacity:
+			lines = append(lines, "Cluster capacity", "")
+			if len(report.Data.ClusterCapacity) == 0 {
+				lines = append(lines, "No cluster metrics")
+			}
+			for _, c := range report.Data.ClusterCapacity {
+				lines = append(lines,
+					truncatePDFField(c.Name, pdfLineWidth),
+					fmt.Sprintf("    CPU avg %.1f%% max %.1f%%, memory avg %.1f%% max %.1f%%, %d nodes, %d pods",
+						c.AvgCPUPercent, c.MaxCPUPercent, c.AvgMemoryPercent, c.MaxMemoryPercent, c.Nodes, c.Pods))
+			}
+		}
+	}
+	return renderPDF(lines)
+}
+
+// truncatePDFField shortens a value to fit a column
+func truncatePDFField(s string, width int) string {
+	if len(s) <= width {
+		return s
+	}
+	return s[:width-3] + "..."
+}
+
+func optionalUUID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
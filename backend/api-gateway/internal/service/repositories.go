@@ -0,0 +1,84 @@
+// Package service provides the repository interfaces services store aggregates through
+package service
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// The repositories return db.ErrNotFound for missing records. Update writes only
+// the named struct fields, so a fake may ignore them and store the whole value.
+
+// ClusterRepository stores clusters and the nodes last read from them
+type ClusterRepository interface {
+	Create(ctx context.Context, cluster *model.K8sCluster) error
+	FindByID(ctx context.Context, id uuid.UUID) (*model.K8sCluster, error)
+	FindOwned(ctx context.Context, id, userID uuid.UUID) (*model.K8sCluster, error)
+	List(ctx context.Context, filter *db.ClusterFilter) ([]model.K8sCluster, int64, error)
+	Update(ctx context.Context, cluster *model.K8sCluster, fields ...string) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	ListNodes(ctx context.Context, clusterID uuid.UUID) ([]model.ClusterNode, error)
+	ReplaceNodes(ctx context.Context, clusterID uuid.UUID, nodes []model.ClusterNode) error
+	FindVeleroInstallation(ctx context.Context, clusterID uuid.UUID) (*model.VeleroInstallation, error)
+}
+
+// DataSourceRepository stores Prometheus data sources
+type DataSourceRepository interface {
+	Create(ctx context.Context, dataSource *model.PrometheusDataSource) error
+	FindOwned(ctx context.Context, id, userID uuid.UUID) (*model.PrometheusDataSource, error)
+	NameTaken(ctx context.Context, userID uuid.UUID, name string, except uuid.UUID) (bool, error)
+	List(ctx context.Context, filter *db.DataSourceFilter) ([]model.PrometheusDataSource, int64, error)
+	Update(ctx context.Context, dataSource *model.PrometheusDataSource, fields ...string) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// PrometheusAlertRuleRepository stores the alerting rules of Prometheus data sources
+type PrometheusAlertRuleRepository interface {
+	Create(ctx context.Context, rule *model.PrometheusAlertRule) error
+	FindOwned(ctx context.Context, id, userID uuid.UUID) (*model.PrometheusAlertRule, error)
+	NameTaken(ctx context.Context, dataSourceID uuid.UUID, name string, except uuid.UUID) (bool, error)
+	List(ctx context.Context, filter *db.PrometheusAlertRuleFilter) ([]model.PrometheusAlertRule, int64, error)
+	Update(ctx context.Context, rule *model.PrometheusAlertRule, fields ...string) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// AlertRuleRepository stores the rules the alert engine evaluates
+type AlertRuleRepository interface {
+	Create(ctx context.Context, rule *model.AlertRule) error
+	FindOwned(ctx context.Context, id, userID uuid.UUID) (*model.AlertRule, error)
+	List(ctx context.Context, filter *db.AlertRuleFilter) ([]model.AlertRule, int64, error)
+	Update(ctx context.Context, rule *model.AlertRule, fields ...string) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// HelmRepoRepository stores Helm chart repositories
+type HelmRepoRepository interface {
+	Create(ctx context.Context, repo *model.HelmRepository) error
+	FindOwned(ctx context.Context, id, userID uuid.UUID) (*model.HelmRepository, error)
+	NameTaken(ctx context.Context, userID uuid.UUID, name string, except uuid.UUID) (bool, error)
+	List(ctx context.Context, filter *db.HelmRepoFilter) ([]model.HelmRepository, int64, error)
+	Update(ctx context.Context, repo *model.HelmRepository, fields ...string) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// TagRepository stores the tags of clusters, data sources, dashboards, alert
+// rules and Helm releases
+type TagRepository interface {
+	FindMany(ctx context.Context, resourceType model.TagResourceType, ids []uuid.UUID) (map[uuid.UUID]map[string]string, error)
+	Resolve(ctx context.Context, resourceType model.TagResourceType, ids []uuid.UUID, owner *uuid.UUID) ([]uuid.UUID, error)
+	Replace(ctx context.Context, resourceType model.TagResourceType, id uuid.UUID, tags map[string]string, userID uuid.UUID) error
+	Apply(ctx context.Context, resourceType model.TagResourceType, ids []uuid.UUID, add map[string]string, remove []string, userID uuid.UUID) error
+	Keys(ctx context.Context, userID uuid.UUID, resourceType model.TagResourceType) ([]model.TagKey, error)
+}
+
+var (
+	_ ClusterRepository             = (*db.ClusterRepository)(nil)
+	_ DataSourceRepository          = (*db.DataSourceRepository)(nil)
+	_ PrometheusAlertRuleRepository = (*db.PrometheusAlertRuleRepository)(nil)
+	_ AlertRuleRepository           = (*db.AlertRuleRepository)(nil)
+	_ HelmRepoRepository            = (*db.HelmRepoRepository)(nil)
+	_ TagRepository                 = (*db.TagRepository)(nil)
+)
@@ -0,0 +1,370 @@
+// Package service provides live watches of the pods, deployments and events
+// of cluster namespaces, shared between connections through informers
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// resourceWatchHistory is how many deltas of a namespace are kept for
+	// watches resuming from a resource version
+	resourceWatchHistory = 1000
+	// resourceWatchLinger is how long a namespace's informers keep running
+	// with no watch left, so clients reconnecting can resume
+	resourceWatchLinger = 2 * time.Minute
+	// resourceWatchSyncTimeout bounds the initial list of a kind
+	resourceWatchSyncTimeout = 30 * time.Second
+)
+
+// ErrResourceWatchStopped is returned for watches started while the service shuts down
+var ErrResourceWatchStopped = errors.New("resource watches are stopped")
+
+// ResourceWatchService shares one informer per cluster namespace between
+// the watches of that namespace. Each namespace keeps its recent deltas so a
+// watch can resume from the resource version of the last delta it received.
+type ResourceWatchService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	hubs    map[resourceWatchKey]*resourceWatchHub
+	stopped bool
+}
+
+type resourceWatchKey struct {
+	clusterID uuid.UUID
+	namespace string
+}
+
+// NewResourceWatchService creates a new resource watch service
+func NewResourceWatchService(db *gorm.DB, logger *zap.Logger) *ResourceWatchService {
+	return &ResourceWatchService{
+		db:     db,
+		logger: logger,
+		hubs:   make(map[resourceWatchKey]*resourceWatchHub),
+	}
+}
+
+// Run stops every informer when ctx is done
+func (s *ResourceWatchService) Run(ctx context.Context) {
+	<-ctx.Done()
+
+	s.mu.Lock()
+	s.stopped = true
+	hubs := s.hubs
+	s.hubs = make(map[resourceWatchKey]*resourceWatchHub)
+	s.mu.Unlock()
+
+	for _, hub := range hubs {
+		hub.stop()
+	}
+}
+
+// Watch starts a watch of kinds in a namespace of a cluster. When
+// resourceVersion is that of a delta still kept for the namespace, the watch
+// begins with the deltas that followed it; otherwise it begins with the
+// current objects, and Resumed is false. Deltas after that are delivered on
+// the watch's channel, buffered up to buffer.
+func (s *ResourceWatchService) Watch(ctx context.Context, clusterID uuid.UUID, namespace string, kinds []k8s.WatchKind, resourceVersion string, buffer int) (*ResourceWatch, error) {
+	hub, err := s.acquire(clusterID, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	syncCtx, cancel := context.WithTimeout(ctx, resourceWatchSyncTimeout)
+	defer cancel()
+	for _, kind := range kinds {
+		bookmark, err := hub.informer.Watch(syncCtx, kind)
+		if err != nil {
+			s.release(hub)
+			return nil, err
+		}
+		if bookmark != nil {
+			hub.started(*bookmark)
+		}
+	}
+	return hub.subscribe(kinds, resourceVersion, buffer), nil
+}
+
+// acquire returns the hub of a namespace, creating it when it has none, and
+// holds it until released
+func (s *ResourceWatchService) acquire(clusterID uuid.UUID, namespace string) (*resourceWatchHub, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return nil, ErrResourceWatchStopped
+	}
+
+	key := resourceWatchKey{clusterID: clusterID, namespace: namespace}
+	hub, ok := s.hubs[key]
+	if !ok {
+		client, err := s.clusterClient(clusterID)
+		if err != nil {
+			return nil, err
+		}
+		hub = &resourceWatchHub{
+			service: s,
+			key:     key,
+			client:  client,
+			starts:  make(map[k8s.WatchKind]int64),
+			subs:    make(map[*ResourceWatch]struct{}),
+		}
+		hub.informer = client.NewNamespaceInformer(namespace, hub.publish)
+		s.hubs[key] = hub
+	}
+	hub.refs++
+	if hub.linger != nil {
+		hub.linger.Stop()
+		hub.linger = nil
+	}
+	return hub, nil
+}
+
+// release gives up a hold on a hub. The hub's informers are stopped once it
+// has been left unheld for resourceWatchLinger.
+func (s *ResourceWatchService) release(hub *resourceWatchHub) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hub.refs--
+	if hub.refs > 0 || s.hubs[hub.key] != hub {
+		return
+	}
+	hub.linger = time.AfterFunc(resourceWatchLinger, func() {
+		s.mu.Lock()
+		if hub.refs > 0 || s.hubs[hub.key] != hub {
+			s.mu.Unlock()
+			return
+		}
+		delete(s.hubs, hub.key)
+		s.mu.Unlock()
+
+		hub.stop()
+		s.logger.Debug("stopped idle namespace informer",
+			zap.String("cluster_id", hub.key.clusterID.String()),
+			zap.String("namespace", hub.key.namespace))
+	})
+}
+
+func (s *ResourceWatchService) clusterClient(clusterID uuid.UUID) (*k8s.ClusterClient, error) {
+	var cluster model.K8sCluster
+	if err := s.db.Where("id = ?", clusterID).First(&cluster).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrClusterNotFound
+		}
+		return nil, err
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{
+		Kubeconfig: []byte(cluster.Kubeconfig),
+		Endpoint:   cluster.Endpoint,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+	return client, nil
+}
+
+// resourceWatchHub fans the deltas of one namespace's informer out to its
+// watches and keeps the most recent of them
+type resourceWatchHub struct {
+	service  *ResourceWatchService
+	key      resourceWatchKey
+	client   *k8s.ClusterClient
+	informer *k8s.NamespaceInformer
+
+	// refs and linger are guarded by the service's mutex
+	refs   int
+	linger *time.Timer
+
+	mu      sync.Mutex
+	seq     int64                   // Sequence number of the last delta
+	history []resourceWatchEntry    // Oldest first, at most resourceWatchHistory
+	starts  map[k8s.WatchKind]int64 // Sequence number of each kind's bookmark
+	subs    map[*ResourceWatch]struct{}
+	stopped bool
+}
+
+type resourceWatchEntry struct {
+	seq   int64
+	delta k8s.WatchDelta
+}
+
+// started records the bookmark of a kind whose informer synced
+func (h *resourceWatchHub) started(bookmark k8s.WatchDelta) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	h.starts[bookmark.Kind] = h.seq
+	h.remember(bookmark)
+}
+
+// publish records a delta and delivers it to the watches of its kind. A
+// watch whose buffer is full is closed as overflowed rather than left with a
+// gap.
+func (h *resourceWatchHub) publish(delta k8s.WatchDelta) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	h.remember(delta)
+	for sub := range h.subs {
+		if !sub.kinds[delta.Kind] {
+			continue
+		}
+		select {
+		case sub.deltas <- delta:
+		default:
+			sub.overflowed = true
+			h.drop(sub)
+		}
+	}
+}
+
+func (h *resourceWatchHub) remember(delta k8s.WatchDelta) {
+	if len(h.history) == resourceWatchHistory {
+		copy(h.history, h.history[1:])
+		h.history = h.history[:len(h.history)-1]
+	}
+	h.history = append(h.history, resourceWatchEntry{seq: h.seq, delta: delta})
+}
+
+// subscribe adds a watch of kinds, which begins with the deltas following
+// resourceVersion when it can resume from it, or else the current objects.
+// Working under the hub's lock, nothing published in between is missed.
+func (h *resourceWatchHub) subscribe(kinds []k8s.WatchKind, resourceVersion string, buffer int) *ResourceWatch {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &ResourceWatch{
+		hub:    h,
+		kinds:  make(map[k8s.WatchKind]bool, len(kinds)),
+		deltas: make(chan k8s.WatchDelta, buffer),
+	}
+	if h.stopped {
+		close(sub.deltas)
+		return sub
+	}
+	for _, kind := range kinds {
+		sub.kinds[kind] = true
+	}
+	if len(h.history) > 0 {
+		sub.ResourceVersion = h.history[len(h.history)-1].delta.ResourceVersion
+	}
+
+	if from, ok := h.resumeFrom(kinds, resourceVersion); ok {
+		sub.Resumed = true
+		for _, entry := range h.history[from+1:] {
+			if sub.kinds[entry.delta.Kind] && entry.delta.Type != k8s.WatchBookmark {
+				sub.Initial = append(sub.Initial, entry.delta)
+			}
+		}
+	} else {
+		for _, kind := range kinds {
+			sub.Initial = append(sub.Initial, h.informer.List(kind)...)
+		}
+	}
+
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// resumeFrom finds the first kept delta at resourceVersion. Deletions carry
+// the version of the object's last change, so resuming from the first one
+// replays a deletion rather than skip it. A watch cannot resume from before
+// one of its kinds was started.
+func (h *resourceWatchHub) resumeFrom(kinds []k8s.WatchKind, resourceVersion string) (int, bool) {
+	if resourceVersion == "" {
+		return 0, false
+	}
+	for i, entry := range h.history {
+		if entry.delta.ResourceVersion != resourceVersion {
+			continue
+		}
+		for _, kind := range kinds {
+			if start, ok := h.starts[kind]; !ok || start > entry.seq {
+				return 0, false
+			}
+		}
+		return i, true
+	}
+	return 0, false
+}
+
+// drop removes a watch and closes its channel. It must be called with the
+// hub's lock held.
+func (h *resourceWatchHub) drop(sub *ResourceWatch) {
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+	delete(h.subs, sub)
+	close(sub.deltas)
+}
+
+// stop closes every watch and stops the informer
+func (h *resourceWatchHub) stop() {
+	h.informer.Stop()
+	h.client.Close()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopped = true
+	for sub := range h.subs {
+		h.drop(sub)
+	}
+}
+
+// ResourceWatch is a stream of the changes to some kinds of objects of a
+// namespace
+type ResourceWatch struct {
+	// Initial holds the deltas the watch begins with: those since the
+	// resource version it resumed from, or else the current objects
+	Initial []k8s.WatchDelta
+	// Resumed reports whether Initial continues from the requested version
+	Resumed bool
+	// ResourceVersion is of the namespace's latest delta when the watch began;
+	// watches can resume from it. It is empty until something was recorded.
+	ResourceVersion string
+
+	hub        *resourceWatchHub
+	kinds      map[k8s.WatchKind]bool
+	deltas     chan k8s.WatchDelta
+	overflowed bool
+	closed     bool
+}
+
+// Deltas returns the channel the watch's deltas are delivered on. It is
+// closed when the watch overflows, the service stops or Close is called.
+func (w *ResourceWatch) Deltas() <-chan k8s.WatchDelta {
+	return w.deltas
+}
+
+// Overflowed reports whether the watch was closed because its buffer filled
+// up. It can be restarted from the last delta received.
+func (w *ResourceWatch) Overflowed() bool {
+	w.hub.mu.Lock()
+	defer w.hub.mu.Unlock()
+	return w.overflowed
+}
+
+// Close ends the watch
+func (w *ResourceWatch) Close() {
+	w.hub.mu.Lock()
+	if w.closed {
+		w.hub.mu.Unlock()
+		return
+	}
+	w.closed = true
+	w.hub.drop(w)
+	w.hub.mu.Unlock()
+
+	w.hub.service.release(w.hub)
+}
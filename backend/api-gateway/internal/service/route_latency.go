@@ -0,0 +1,329 @@
+// Package service provides latency SLOs for the routes of the gateway
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// routeLatencyEvaluateInterval is how often routes are checked against their thresholds
+	routeLatencyEvaluateInterval = time.Minute
+	// maxRouteLatencySamples is how many of its latest requests a route keeps
+	maxRouteLatencySamples = 512
+	// maxLatencyRoutes bounds the routes tracked; requests of further routes
+	// are tracked together as routeLatencyOther
+	maxLatencyRoutes  = 1000
+	routeLatencyOther = "other"
+)
+
+// RouteLatencyThreshold is the p95 and p99 latency a route should stay within.
+// A threshold of 0 is not checked.
+type RouteLatencyThreshold struct {
+	P95 time.Duration
+	P99 time.Duration
+}
+
+// RouteLatencyOptions configures route latency tracking
+type RouteLatencyOptions struct {
+	Window      time.Duration                    // Requests the percentiles are computed over
+	Default     RouteLatencyThreshold            // Thresholds of routes not in Routes
+	Routes      map[string]RouteLatencyThreshold // Thresholds by route, such as "GET /api/v1/hosts/*"
+	MinRequests int                              // Requests a route needs in the window to be judged
+	AlertUserID uuid.UUID                        // Owner of the alerts breaches raise; uuid.Nil only logs them
+}
+
+// RouteLatencyService tracks the p95 and p99 latency of each route of the
+// gateway over a sliding window. Routes past their thresholds are logged and,
+// when an alert owner is configured, raise a platform alert that resolves
+// once they recover. Each gateway judges the requests it served.
+type RouteLatencyService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	engine *AlertEngine
+	opts   RouteLatencyOptions
+
+	mu     sync.Mutex
+	routes map[string]*routeLatency
+
+	// Alert rules by route, loaded on the first evaluation; only Run uses them
+	rules map[string]*model.AlertRule
+}
+
+// routeLatency is the latest requests of a route, in a ring
+type routeLatency struct {
+	samples       []latencySample
+	next          int
+	breachedSince *time.Time
+}
+
+type latencySample struct {
+	at       time.Time
+	duration time.Duration
+}
+
+// NewRouteLatencyService creates a new route latency service. Breaches only
+// raise alerts when db and engine are set.
+func NewRouteLatencyService(db *gorm.DB, logger *zap.Logger, engine *AlertEngine, opts RouteLatencyOptions) *RouteLatencyService {
+	if opts.Window <= 0 {
+		opts.Window = 5 * time.Minute
+	}
+	return &RouteLatencyService{
+		db:     db,
+		logger: logger,
+		engine: engine,
+		opts:   opts,
+		routes: make(map[string]*routeLatency),
+	}
+}
+
+// Observe records how long a request of a route took
+func (s *RouteLatencyService) Observe(route string, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.routes[route]
+	if !ok {
+		if len(s.routes) >= maxLatencyRoutes {
+			route = routeLatencyOther
+			r = s.routes[route]
+		}
+		if r == nil {
+			r = &routeLatency{}
+			s.routes[route] = r
+		}
+	}
+	sample := latencySample{at: time.Now(), duration: duration}
+	if len(r.samples) < maxRouteLatencySamples {
+		r.samples = append(r.samples, sample)
+		return
+	}
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % maxRouteLatencySamples
+}
+
+// Report returns the latency of every route with requests in the window,
+// slowest p99 first
+func (s *RouteLatencyService) Report() []model.RouteLatency {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := make([]model.RouteLatency, 0, len(s.routes))
+	for route, r := range s.routes {
+		latency, _ := s.measure(route, r, now)
+		if latency.Requests > 0 {
+			report = append(report, latency)
+		}
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].P99Ms != report[j].P99Ms {
+			return report[i].P99Ms > report[j].P99Ms
+		}
+		return report[i].Route < report[j].Route
+	})
+	return report
+}
+
+// Run checks the routes against their thresholds until ctx is done
+func (s *RouteLatencyService) Run(ctx context.Context) {
+	ticker := time.NewTicker(routeLatencyEvaluateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.evaluate()
+		}
+	}
+}
+
+// routeBreach is a route's latency and by how much it exceeds its thresholds
+type routeBreach struct {
+	latency model.RouteLatency
+	ratio   float64
+	changed bool
+}
+
+func (s *RouteLatencyService) evaluate() {
+	now := time.Now()
+	s.mu.Lock()
+	breaches := make(map[string]routeBreach, len(s.routes))
+	for route, r := range s.routes {
+		latency, ratio := s.measure(route, r, now)
+		changed := latency.Breached != (r.breachedSince != nil)
+		switch {
+		case latency.Breached && r.breachedSince == nil:
+			since := now
+			r.breachedSince = &since
+			latency.BreachedSince = &since
+		case !latency.Breached:
+			r.breachedSince = nil
+		}
+		breaches[route] = routeBreach{latency: latency, ratio: ratio, changed: changed}
+		if latency.Requests == 0 {
+			delete(s.routes, route)
+		}
+	}
+	s.mu.Unlock()
+
+	for route, b := range breaches {
+		if !b.changed {
+			continue
+		}
+		fields := []zap.Field{
+			zap.String("route", route),
+			zap.Int("requests", b.latency.Requests),
+			zap.Float64("p95_ms", b.latency.P95Ms),
+			zap.Float64("p99_ms", b.latency.P99Ms),
+			zap.Float64("p95_threshold_ms", b.latency.P95ThresholdMs),
+			zap.Float64("p99_threshold_ms", b.latency.P99ThresholdMs),
+		}
+		if b.latency.Breached {
+			s.logger.Warn("route latency above SLO", fields...)
+		} else {
+			s.logger.Info("route latency back within SLO", fields...)
+		}
+	}
+
+	if s.db != nil && s.engine != nil && s.opts.AlertUserID != uuid.Nil {
+		s.alert(breaches, now)
+	}
+}
+
+// measure computes the percentiles of a route over the window, whether they
+// breach its thresholds, and the largest ratio of a percentile to its threshold
+func (s *RouteLatencyService) measure(route string, r *routeLatency, now time.Time) (model.RouteLatency, float64) {
+	threshold := s.threshold(route)
+	latency := model.RouteLatency{
+		Route:          route,
+		P95ThresholdMs: durationMs(threshold.P95),
+		P99ThresholdMs: durationMs(threshold.P99),
+		BreachedSince:  r.breachedSince,
+	}
+
+	durations := make([]time.Duration, 0, len(r.samples))
+	for _, sample := range r.samples {
+		if now.Sub(sample.at) <= s.opts.Window {
+			durations = append(durations, sample.duration)
+		}
+	}
+	latency.Requests = len(durations)
+	if latency.Requests == 0 {
+		return latency, 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	p95, p99 := percentile(durations, 0.95), percentile(durations, 0.99)
+	latency.P95Ms, latency.P99Ms = durationMs(p95), durationMs(p99)
+
+	if latency.Requests < s.opts.MinRequests {
+		return latency, 0
+	}
+	var ratio float64
+	if threshold.P95 > 0 {
+		ratio = math.Max(ratio, float64(p95)/float64(threshold.P95))
+	}
+	if threshold.P99 > 0 {
+		ratio = math.Max(ratio, float64(p99)/float64(threshold.P99))
+	}
+	latency.Breached = ratio > 1
+	return latency, ratio
+}
+
+// threshold returns the thresholds of a route
+func (s *RouteLatencyService) threshold(route string) RouteLatencyThreshold {
+	if threshold, ok := s.opts.Routes[route]; ok {
+		return threshold
+	}
+	return s.opts.Default
+}
+
+// alert evaluates the alert rule of every breached route, and of every route
+// with a rule, so the alerts of recovered and idle routes resolve
+func (s *RouteLatencyService) alert(breaches map[string]routeBreach, now time.Time) {
+	if s.rules == nil {
+		var rules []model.AlertRule
+		if err := s.db.Where("metric_type = ?", model.AlertMetricRouteLatency).Find(&rules).Error; err != nil {
+			s.logger.Error("failed to load route latency alert rules", zap.Error(err))
+			return
+		}
+		s.rules = make(map[string]*model.AlertRule, len(rules))
+		for i := range rules {
+			s.rules[rules[i].TargetID] = &rules[i]
+		}
+	}
+
+	for route, b := range breaches {
+		if _, ok := s.rules[route]; ok || !b.latency.Breached {
+			continue
+		}
+		rule := s.routeAlertRule(route)
+		if err := s.db.Create(rule).Error; err != nil {
+			s.logger.Error("failed to create route latency alert rule", zap.String("route", route), zap.Error(err))
+			continue
+		}
+		s.rules[route] = rule
+	}
+
+	for route, rule := range s.rules {
+		if !rule.Enabled || rule.SilencedUntil != nil && rule.SilencedUntil.After(now) {
+			continue
+		}
+		// Routes without requests in the window have recovered
+		if err := s.engine.EvaluateValue(rule, breaches[route].ratio); err != nil {
+			s.logger.Error("failed to evaluate route latency alert rule", zap.String("route", route), zap.Error(err))
+		}
+	}
+}
+
+// routeAlertRule is the alert rule of a route, which fires while a percentile
+// of the route is above its threshold
+func (s *RouteLatencyService) routeAlertRule(route string) *model.AlertRule {
+	threshold := s.threshold(route)
+	var limits []string
+	if threshold.P95 > 0 {
+		limits = append(limits, "p95 above "+threshold.P95.String())
+	}
+	if threshold.P99 > 0 {
+		limits = append(limits, "p99 above "+threshold.P99.String())
+	}
+	return &model.AlertRule{
+		ID:     uuid.New(),
+		UserID: s.opts.AlertUserID,
+		Name:   fmt.Sprintf("%s: latency above SLO", route),
+		Description: fmt.Sprintf("%s over %s, by the ratio of latency to threshold. Managed by the gateway's route latency tracking.",
+			strings.Join(limits, " or "), s.opts.Window),
+		Enabled:    true,
+		TargetType: "route",
+		TargetID:   route,
+		MetricType: model.AlertMetricRouteLatency,
+		Operator:   ">",
+		Threshold:  1,
+		Duration:   int32(s.opts.Window.Seconds()),
+		Severity:   model.AlertSeverityWarning,
+	}
+}
+
+// percentile returns the nearest-rank percentile q of sorted durations
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
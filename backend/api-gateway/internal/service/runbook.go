@@ -0,0 +1,569 @@
+// Package service provides runbooks, the remediations run for alerts of a rule
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Runbook limits
+const (
+	defaultRunbookCooldown   = 600 // seconds
+	maxRunbookCooldown       = 7 * 24 * 60 * 60
+	defaultRunbookMaxPerHour = 3
+	maxRunbookMaxPerHour     = 60
+	runbookBatchTaskTimeout  = 30 * time.Minute
+	runbookKubernetesTimeout = time.Minute
+)
+
+var (
+	// ErrRunbookNotFound is returned when the user has no such runbook
+	ErrRunbookNotFound = errors.New("runbook not found")
+	// ErrInvalidRunbook is returned when a runbook definition or run is rejected
+	ErrInvalidRunbook = errors.New("invalid runbook")
+	// ErrRunbookGuardrail is returned when a guardrail holds back a run
+	ErrRunbookGuardrail = errors.New("runbook held back")
+)
+
+// RunbookService manages the runbooks attached to alert rules and runs them,
+// automatically when an alert of the rule fires or on request. Runs are recorded
+// against the alert that triggered them, and actions are taken with the
+// permissions of the runbook's owner.
+type RunbookService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	executor *BatchTaskExecutor
+	events   *EventBus
+	// mu serializes guardrail checks with the runs they allow
+	mu sync.Mutex
+}
+
+// NewRunbookService creates a new runbook service
+func NewRunbookService(db *gorm.DB, logger *zap.Logger, executor *BatchTaskExecutor) *RunbookService {
+	if executor == nil {
+		executor = NewBatchTaskExecutor(db, logger)
+	}
+	return &RunbookService{db: db, logger: logger, executor: executor}
+}
+
+// SetEventBus sets the bus runbook execution events are published on
+func (s *RunbookService) SetEventBus(events *EventBus) {
+	s.events = events
+}
+
+// List returns the runbooks of one of the user's rules
+func (s *RunbookService) List(userID, ruleID uuid.UUID) ([]model.Runbook, error) {
+	if _, err := s.rule(userID, ruleID); err != nil {
+		return nil, err
+	}
+	runbooks := []model.Runbook{}
+	if err := s.db.Where("rule_id = ? AND user_id = ?", ruleID, userID).Order("name ASC").Find(&runbooks).Error; err != nil {
+		return nil, err
+	}
+	return runbooks, nil
+}
+
+// Get returns one of the user's runbooks
+func (s *RunbookService) Get(userID, id uuid.UUID) (*model.Runbook, error) {
+	var runbook model.Runbook
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&runbook).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRunbookNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &runbook, nil
+}
+
+// Create attaches a runbook to one of the user's rules
+func (s *RunbookService) Create(userID, ruleID uuid.UUID, req *model.CreateRunbookRequest) (*model.Runbook, error) {
+	if _, err := s.rule(userID, ruleID); err != nil {
+		return nil, err
+	}
+
+	runbook := &model.Runbook{
+		ID:             uuid.New(),
+		UserID:         userID,
+		RuleID:         ruleID,
+		Name:           strings.TrimSpace(req.Name),
+		Description:    req.Description,
+		Action:         req.Action,
+		Trigger:        req.Trigger,
+		Enabled:        req.Enabled == nil || *req.Enabled,
+		TaskTemplateID: req.TaskTemplateID,
+		AlertHostOnly:  req.AlertHostOnly,
+		ClusterID:      req.ClusterID,
+		Namespace:      req.Namespace,
+		Deployment:     req.Deployment,
+		ScaleBy:        req.ScaleBy,
+		MaxReplicas:    req.MaxReplicas,
+		Cooldown:       defaultRunbookCooldown,
+		MaxPerHour:     defaultRunbookMaxPerHour,
+	}
+	if runbook.Trigger == "" {
+		runbook.Trigger = model.RunbookTriggerManual
+	}
+	if req.Cooldown != nil {
+		runbook.Cooldown = *req.Cooldown
+	}
+	if req.MaxPerHour != nil {
+		runbook.MaxPerHour = *req.MaxPerHour
+	}
+	if err := s.validate(runbook); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(runbook).Error; err != nil {
+		return nil, err
+	}
+	return runbook, nil
+}
+
+// Update changes one of the user's runbooks
+func (s *RunbookService) Update(userID, id uuid.UUID, req *model.UpdateRunbookRequest) (*model.Runbook, error) {
+	runbook, err := s.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		runbook.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		runbook.Description = *req.Description
+	}
+	if req.Trigger != nil {
+		runbook.Trigger = *req.Trigger
+	}
+	if req.Enabled != nil {
+		runbook.Enabled = *req.Enabled
+	}
+	if req.TaskTemplateID != nil {
+		runbook.TaskTemplateID = req.TaskTemplateID
+	}
+	if req.AlertHostOnly != nil {
+		runbook.AlertHostOnly = *req.AlertHostOnly
+	}
+	if req.ClusterID != nil {
+		runbook.ClusterID = req.ClusterID
+	}
+	if req.Namespace != nil {
+		runbook.Namespace = *req.Namespace
+	}
+	if req.Deployment != nil {
+		runbook.Deployment = *req.Deployment
+	}
+	if req.ScaleBy != nil {
+		runbook.ScaleBy = *req.ScaleBy
+	}
+	if req.MaxReplicas != nil {
+		runbook.MaxReplicas = *req.MaxReplicas
+	}
+	if req.Cooldown != nil {
+		runbook.Cooldown = *req.Cooldown
+	}
+	if req.MaxPerHour != nil {
+		runbook.MaxPerHour = *req.MaxPerHour
+	}
+	if err := s.validate(runbook); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(runbook).Error; err != nil {
+		return nil, err
+	}
+	return runbook, nil
+}
+
+// Delete removes one of the user's runbooks and its execution history
+func (s *RunbookService) Delete(userID, id uuid.UUID) error {
+	runbook, err := s.Get(userID, id)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("runbook_id = ?", runbook.ID).Delete(&model.RunbookExecution{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(runbook).Error
+	})
+}
+
+// Executions returns a page of the user's runbook executions, newest first,
+// optionally only those of one runbook or alert
+func (s *RunbookService) Executions(userID uuid.UUID, runbookID, alertID *uuid.UUID, page, pageSize int) ([]model.RunbookExecution, int64, error) {
+	query := s.db.Model(&model.RunbookExecution{}).Where("user_id = ?", userID)
+	if runbookID != nil {
+		query = query.Where("runbook_id = ?", *runbookID)
+	}
+	if alertID != nil {
+		query = query.Where("alert_id = ?", *alertID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	executions := []model.RunbookExecution{}
+	if err := query.Order("started_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&executions).Error; err != nil {
+		return nil, 0, err
+	}
+	return executions, total, nil
+}
+
+// Trigger starts the enabled automatic runbooks of a firing alert's rule. Runs
+// held back by guardrails are recorded as skipped.
+func (s *RunbookService) Trigger(alert *model.Alert) {
+	var runbooks []model.Runbook
+	if err := s.db.Where("rule_id = ? AND trigger = ? AND enabled = ?", alert.RuleID, model.RunbookTriggerAuto, true).
+		Find(&runbooks).Error; err != nil {
+		s.logger.Error("failed to load runbooks",
+			zap.String("ruleId", alert.RuleID.String()),
+			zap.Error(err),
+		)
+		return
+	}
+
+	for i := range runbooks {
+		if _, err := s.start(&runbooks[i], alert, nil); err != nil && !errors.Is(err, ErrRunbookGuardrail) {
+			s.logger.Error("failed to start runbook",
+				zap.String("runbookId", runbooks[i].ID.String()),
+				zap.String("alertId", alert.ID.String()),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// Execute runs one of the user's runbooks for a firing alert of its rule. The
+// run continues in the background; its execution is returned as it starts.
+func (s *RunbookService) Execute(userID, id, alertID uuid.UUID) (*model.RunbookExecution, error) {
+	runbook, err := s.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !runbook.Enabled {
+		return nil, fmt.Errorf("%w: runbook is disabled", ErrInvalidRunbook)
+	}
+
+	var alert model.Alert
+	err = s.db.Where("id = ? AND rule_id = ? AND user_id = ? AND status IN ?", alertID, runbook.RuleID, userID,
+		[]model.AlertStatus{model.AlertStatusFiring, model.AlertStatusSilenced}).First(&alert).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: alert is not a firing alert of the runbook's rule", ErrInvalidRunbook)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s.start(runbook, &alert, &userID)
+}
+
+// start checks the runbook's guardrails and runs it in the background for the
+// alert. by is the user who asked for a manual run, or nil for automatic runs.
+func (s *RunbookService) start(runbook *model.Runbook, alert *model.Alert, by *uuid.UUID) (*model.RunbookExecution, error) {
+	trigger := model.RunbookTriggerAuto
+	if by != nil {
+		trigger = model.RunbookTriggerManual
+	}
+	execution := &model.RunbookExecution{
+		ID:          uuid.New(),
+		RunbookID:   runbook.ID,
+		RuleID:      runbook.RuleID,
+		AlertID:     alert.ID,
+		UserID:      runbook.UserID,
+		Trigger:     trigger,
+		TriggeredBy: by,
+		Status:      model.RunbookExecutionRunning,
+		StartedAt:   time.Now(),
+	}
+
+	s.mu.Lock()
+	reason, err := s.guardrail(runbook, execution.StartedAt)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if reason != "" {
+		defer s.mu.Unlock()
+		// Manual runs are refused rather than recorded; the user sees why
+		if by != nil {
+			return nil, fmt.Errorf("%w: %s", ErrRunbookGuardrail, reason)
+		}
+		execution.Status = model.RunbookExecutionSkipped
+		execution.Message = reason
+		execution.CompletedAt = &execution.StartedAt
+		if err := s.db.Create(execution).Error; err != nil {
+			return nil, err
+		}
+		s.publish(execution)
+		return execution, fmt.Errorf("%w: %s", ErrRunbookGuardrail, reason)
+	}
+	err = s.db.Create(execution).Error
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("runbook started",
+		zap.String("runbookId", runbook.ID.String()),
+		zap.String("alertId", alert.ID.String()),
+		zap.String("trigger", string(trigger)),
+	)
+	run := *execution
+	go s.run(runbook, alert, &run)
+	return execution, nil
+}
+
+// guardrail returns why the runbook may not run at now, or an empty string
+func (s *RunbookService) guardrail(runbook *model.Runbook, now time.Time) (string, error) {
+	ran := s.db.Model(&model.RunbookExecution{}).
+		Where("runbook_id = ? AND status <> ?", runbook.ID, model.RunbookExecutionSkipped)
+
+	if runbook.Cooldown > 0 {
+		var last model.RunbookExecution
+		err := ran.Session(&gorm.Session{}).Order("started_at DESC").First(&last).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", err
+		}
+		if err == nil {
+			if until := last.StartedAt.Add(time.Duration(runbook.Cooldown) * time.Second); now.Before(until) {
+				return fmt.Sprintf("cooling down until %s", until.UTC().Format(time.RFC3339)), nil
+			}
+		}
+	}
+
+	if runbook.MaxPerHour > 0 {
+		var count int64
+		if err := ran.Session(&gorm.Session{}).Where("started_at > ?", now.Add(-time.Hour)).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count >= int64(runbook.MaxPerHour) {
+			return fmt.Sprintf("limit of %d runs per hour reached", runbook.MaxPerHour), nil
+		}
+	}
+	return "", nil
+}
+
+// run takes the runbook's action and records how it went
+func (s *RunbookService) run(runbook *model.Runbook, alert *model.Alert, execution *model.RunbookExecution) {
+	var message string
+	var err error
+	switch runbook.Action {
+	case model.RunbookActionBatchTask:
+		message, err = s.runBatchTask(runbook, alert, execution)
+	case model.RunbookActionRestartDeployment, model.RunbookActionScaleDeployment:
+		message, err = s.runDeploymentAction(runbook)
+	default:
+		err = fmt.Errorf("unknown runbook action %s", runbook.Action)
+	}
+
+	now := time.Now()
+	execution.CompletedAt = &now
+	execution.Status = model.RunbookExecutionSucceeded
+	execution.Message = message
+	if err != nil {
+		execution.Status = model.RunbookExecutionFailed
+		execution.Message = err.Error()
+		s.logger.Warn("runbook failed",
+			zap.String("runbookId", runbook.ID.String()),
+			zap.String("alertId", alert.ID.String()),
+			zap.Error(err),
+		)
+	}
+	if err := s.db.Save(execution).Error; err != nil {
+		s.logger.Error("failed to record runbook execution",
+			zap.String("executionId", execution.ID.String()),
+			zap.Error(err),
+		)
+	}
+	s.publish(execution)
+}
+
+// runBatchTask runs a copy of the runbook's batch task on the template's hosts,
+// or on the alert's host
+func (s *RunbookService) runBatchTask(runbook *model.Runbook, alert *model.Alert, execution *model.RunbookExecution) (string, error) {
+	var template model.BatchTask
+	if err := s.db.Where("id = ? AND user_id = ?", runbook.TaskTemplateID, runbook.UserID).First(&template).Error; err != nil {
+		return "", fmt.Errorf("batch task template not found: %w", err)
+	}
+
+	var hostIDs []uuid.UUID
+	if runbook.AlertHostOnly {
+		if alert.HostID == nil {
+			return "", errors.New("the alert has no host to run the task on")
+		}
+		hostIDs = []uuid.UUID{*alert.HostID}
+	} else if err := s.db.Model(&model.BatchTaskHost{}).Where("batch_task_id = ?", template.ID).
+		Distinct().Pluck("host_id", &hostIDs).Error; err != nil {
+		return "", fmt.Errorf("failed to load template hosts: %w", err)
+	}
+	if len(hostIDs) == 0 {
+		return "", errors.New("the batch task template has no hosts")
+	}
+
+	task := &model.BatchTask{
+		ID:          uuid.New(),
+		UserID:      runbook.UserID,
+		Name:        fmt.Sprintf("%s (runbook %s)", template.Name, runbook.Name),
+		Description: fmt.Sprintf("Run by runbook %s for alert %s", runbook.Name, alert.Title),
+		Type:        template.Type,
+		Status:      model.BatchTaskStatusPending,
+		Strategy:    template.Strategy,
+		Command:     template.Command,
+		Script:      template.Script,
+		Timeout:     template.Timeout,
+		MaxRetries:  template.MaxRetries,
+		Parallelism: template.Parallelism,
+	}
+	if err := s.db.Create(task).Error; err != nil {
+		return "", fmt.Errorf("failed to create batch task: %w", err)
+	}
+	// Linked before the task runs so the history can point at it meanwhile
+	execution.BatchTaskID = &task.ID
+	s.db.Model(execution).Update("batch_task_id", task.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), runbookBatchTaskTimeout)
+	defer cancel()
+	if err := s.executor.ExecuteTask(ctx, task.ID, hostIDs); err != nil {
+		return "", fmt.Errorf("batch task failed: %w", err)
+	}
+
+	if err := s.db.Where("id = ?", task.ID).First(task).Error; err != nil {
+		return "", fmt.Errorf("failed to load batch task: %w", err)
+	}
+	if task.Status != model.BatchTaskStatusCompleted {
+		return "", fmt.Errorf("batch task %s on %d of %d hosts", task.Status, task.FailedHosts, task.TotalHosts)
+	}
+	return fmt.Sprintf("Batch task completed on %d hosts", task.TotalHosts), nil
+}
+
+// runDeploymentAction restarts or scales up the runbook's deployment
+func (s *RunbookService) runDeploymentAction(runbook *model.Runbook) (string, error) {
+	cluster, err := s.cluster(runbook.UserID, runbook.ClusterID, runbook.Namespace)
+	if err != nil {
+		return "", err
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), runbookKubernetesTimeout)
+	defer cancel()
+
+	if runbook.Action == model.RunbookActionRestartDeployment {
+		if err := client.RestartDeployment(ctx, runbook.Namespace, runbook.Deployment); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Restarted deployment %s/%s", runbook.Namespace, runbook.Deployment), nil
+	}
+
+	from, to, err := client.ScaleDeployment(ctx, runbook.Namespace, runbook.Deployment, runbook.ScaleBy, runbook.MaxReplicas)
+	if err != nil {
+		return "", err
+	}
+	if from == to {
+		return "", fmt.Errorf("deployment %s/%s is already at its limit of %d replicas", runbook.Namespace, runbook.Deployment, from)
+	}
+	return fmt.Sprintf("Scaled deployment %s/%s from %d to %d replicas", runbook.Namespace, runbook.Deployment, from, to), nil
+}
+
+// publish announces a finished or skipped execution to the runbook's owner
+func (s *RunbookService) publish(execution *model.RunbookExecution) {
+	s.events.Publish(execution.UserID, model.EventRunbookExecuted, map[string]string{
+		"runbookId": execution.RunbookID.String(),
+		"ruleId":    execution.RuleID.String(),
+		"alertId":   execution.AlertID.String(),
+		"status":    execution.Status,
+	}, execution)
+}
+
+// validate normalizes a runbook and checks its owner may take its action
+func (s *RunbookService) validate(runbook *model.Runbook) error {
+	if runbook.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRunbook)
+	}
+	switch runbook.Trigger {
+	case model.RunbookTriggerAuto, model.RunbookTriggerManual:
+	default:
+		return fmt.Errorf("%w: trigger must be auto or manual", ErrInvalidRunbook)
+	}
+	if runbook.Cooldown < 0 || runbook.Cooldown > maxRunbookCooldown {
+		return fmt.Errorf("%w: cooldown must be between 0 and %d seconds", ErrInvalidRunbook, maxRunbookCooldown)
+	}
+	if runbook.MaxPerHour < 0 || runbook.MaxPerHour > maxRunbookMaxPerHour {
+		return fmt.Errorf("%w: maxPerHour must be between 0 and %d", ErrInvalidRunbook, maxRunbookMaxPerHour)
+	}
+
+	switch runbook.Action {
+	case model.RunbookActionBatchTask:
+		runbook.ClusterID, runbook.Namespace, runbook.Deployment = nil, "", ""
+		runbook.ScaleBy, runbook.MaxReplicas = 0, 0
+		if runbook.TaskTemplateID == nil {
+			return fmt.Errorf("%w: taskTemplateId is required", ErrInvalidRunbook)
+		}
+		var template model.BatchTask
+		err := s.db.Where("id = ? AND user_id = ?", *runbook.TaskTemplateID, runbook.UserID).First(&template).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: batch task template not found", ErrInvalidRunbook)
+		} else if err != nil {
+			return err
+		}
+		if template.Type != model.BatchTaskTypeCommand && template.Type != model.BatchTaskTypeScript {
+			return fmt.Errorf("%w: the batch task template must be a command or script", ErrInvalidRunbook)
+		}
+
+	case model.RunbookActionRestartDeployment, model.RunbookActionScaleDeployment:
+		runbook.TaskTemplateID, runbook.AlertHostOnly = nil, false
+		runbook.Namespace = strings.TrimSpace(runbook.Namespace)
+		runbook.Deployment = strings.TrimSpace(runbook.Deployment)
+		if runbook.ClusterID == nil || runbook.Namespace == "" || runbook.Deployment == "" {
+			return fmt.Errorf("%w: clusterId, namespace and deployment are required", ErrInvalidRunbook)
+		}
+		if runbook.Action == model.RunbookActionRestartDeployment {
+			runbook.ScaleBy, runbook.MaxReplicas = 0, 0
+		} else if runbook.ScaleBy < 1 || runbook.MaxReplicas < 0 {
+			return fmt.Errorf("%w: scaleBy must be at least 1 and maxReplicas not negative", ErrInvalidRunbook)
+		}
+		if _, err := s.cluster(runbook.UserID, runbook.ClusterID, runbook.Namespace); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidRunbook, err.Error())
+		}
+
+	default:
+		return fmt.Errorf("%w: action must be batch_task, restart_deployment or scale_deployment", ErrInvalidRunbook)
+	}
+	return nil
+}
+
+// cluster loads a runbook's cluster if its owner may update workloads in namespace
+func (s *RunbookService) cluster(userID uuid.UUID, clusterID *uuid.UUID, namespace string) (*model.K8sCluster, error) {
+	var cluster model.K8sCluster
+	if err := s.db.Where("id = ?", clusterID).First(&cluster).Error; err != nil {
+		return nil, errors.New("cluster not found")
+	}
+	if cluster.UserID != userID && !model.UserHasNamespacePermission(s.db, userID, "workloads", "update", cluster.ID, namespace).Allowed {
+		return nil, fmt.Errorf("permission workloads.update required in namespace %s", namespace)
+	}
+	return &cluster, nil
+}
+
+// rule loads one of the user's alert rules
+func (s *RunbookService) rule(userID, ruleID uuid.UUID) (*model.AlertRule, error) {
+	var rule model.AlertRule
+	if err := s.db.Where("id = ? AND user_id = ?", ruleID, userID).First(&rule).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAlertRuleNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
@@ -0,0 +1,919 @@
+// Package service provides SCIM 2.0 user and group provisioning
+package service
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Errors returned by SCIM operations
+var (
+	ErrScimNotFound = errors.New("resource not found")
+	ErrScimConflict = errors.New("resource already exists")
+	ErrScimInvalid  = errors.New("invalid request")
+)
+
+// scimIssuer is the issuer of SCIM identities; there is a single SCIM client
+const scimIssuer = "scim"
+
+// maxScimPageSize caps the count of a SCIM list request
+const maxScimPageSize = 500
+
+// scimFilterPattern matches the equality filters identity providers use to look up
+// resources, such as userName eq "alice"
+var scimFilterPattern = regexp.MustCompile(`^\s*([A-Za-z.]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// ScimService provisions users and groups pushed by an identity provider through
+// SCIM. Only users it provisioned are visible to the client, so local and LDAP
+// accounts cannot be changed through it. Group memberships drive roles through the
+// SSO group role mapping.
+type ScimService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	settings *SettingsService
+	sso      *SSOService
+}
+
+// NewScimService creates a new SCIM service
+func NewScimService(db *gorm.DB, logger *zap.Logger, settings *SettingsService, sso *SSOService) *ScimService {
+	return &ScimService{
+		db:       db,
+		logger:   logger,
+		settings: settings,
+		sso:      sso,
+	}
+}
+
+// Authorize reports whether SCIM is enabled and token is its bearer token
+func (s *ScimService) Authorize(token string) bool {
+	if s == nil || !s.settings.Bool(model.SettingSCIMEnabled) {
+		return false
+	}
+	want := s.settings.String(model.SettingSCIMToken)
+	return want != "" && subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+// ============== Users ==============
+
+// ListUsers lists provisioned users, optionally matching an equality filter on
+// userName, externalId or emails. startIndex is 1-based.
+func (s *ScimService) ListUsers(filter string, startIndex, count int) (*model.ScimListResponse, error) {
+	query := s.db.Model(&model.User{}).
+		Joins("JOIN user_identities ON user_identities.user_id = users.id AND user_identities.provider = ?", model.IdentityProviderSCIM)
+	if filter != "" {
+		attr, value, err := parseScimFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		switch attr {
+		case "username":
+			query = query.Where("users.username = ?", value)
+		case "externalid":
+			query = query.Where("user_identities.subject = ?", value)
+		case "emails", "emails.value":
+			query = query.Where("LOWER(users.email) = LOWER(?)", value)
+		default:
+			return nil, fmt.Errorf("%w: filtering on %s is not supported", ErrScimInvalid, attr)
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	startIndex, count = scimPage(startIndex, count)
+	var users []model.User
+	if err := query.Order("users.created_at").Offset(startIndex - 1).Limit(count).Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	resources := make([]model.ScimUser, 0, len(users))
+	for i := range users {
+		resource, err := s.scimUser(&users[i])
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, *resource)
+	}
+	return scimList(int(total), startIndex, resources, len(resources)), nil
+}
+
+// GetUser returns a provisioned user
+func (s *ScimService) GetUser(id string) (*model.ScimUser, error) {
+	user, _, err := s.provisionedUser(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.scimUser(user)
+}
+
+// CreateUser provisions a user. A user the provider's OIDC login already created is
+// adopted; local and LDAP accounts with the same username or email are conflicts.
+func (s *ScimService) CreateUser(req *model.ScimUser) (*model.ScimUser, error) {
+	if strings.TrimSpace(req.UserName) == "" {
+		return nil, fmt.Errorf("%w: userName is required", ErrScimInvalid)
+	}
+	email := scimEmail(req)
+
+	var existing []model.User
+	if err := s.db.Where("username = ? OR LOWER(email) = LOWER(?)", req.UserName, email).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	var adopt *model.User
+	switch {
+	case len(existing) > 1:
+		return nil, fmt.Errorf("%w: userName and email belong to different accounts", ErrScimConflict)
+	case len(existing) == 1:
+		if existing[0].UserType != model.UserTypeOIDC || s.hasScimIdentity(existing[0].ID) {
+			return nil, fmt.Errorf("%w: an account named %s or with email %s exists", ErrScimConflict, req.UserName, email)
+		}
+		adopt = &existing[0]
+	}
+
+	user := model.User{ID: uuid.New(), UserType: model.UserTypeOIDC}
+	if adopt != nil {
+		user = *adopt
+	}
+	user.Username = req.UserName
+	user.Email = email
+	user.DisplayName = scimDisplayName(req)
+	user.IsActive = req.Active == nil || *req.Active
+
+	externalID := req.ExternalID
+	if externalID == "" {
+		externalID = user.ID.String()
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if adopt != nil {
+			err := tx.Model(&user).Updates(map[string]interface{}{
+				"username":     user.Username,
+				"email":        user.Email,
+				"display_name": user.DisplayName,
+				"is_active":    user.IsActive,
+			}).Error
+			if err != nil {
+				return err
+			}
+		} else {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			// Create skips false, leaving the column default
+			if !user.IsActive {
+				if err := tx.Model(&user).Update("is_active", false).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Create(&model.UserIdentity{
+			UserID:   user.ID,
+			Provider: model.IdentityProviderSCIM,
+			Issuer:   scimIssuer,
+			Subject:  externalID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.syncUserRoles(user.ID); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("SCIM provisioned user",
+		zap.String("userId", user.ID.String()),
+		zap.String("username", user.Username),
+		zap.Bool("adopted", adopt != nil),
+	)
+	return s.scimUser(&user)
+}
+
+// ReplaceUser replaces the attributes of a provisioned user
+func (s *ScimService) ReplaceUser(id string, req *model.ScimUser) (*model.ScimUser, error) {
+	user, identity, err := s.provisionedUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.UserName) == "" {
+		return nil, fmt.Errorf("%w: userName is required", ErrScimInvalid)
+	}
+	email := scimEmail(req)
+
+	var taken int64
+	if err := s.db.Model(&model.User{}).
+		Where("id <> ? AND (username = ? OR LOWER(email) = LOWER(?))", user.ID, req.UserName, email).
+		Count(&taken).Error; err != nil {
+		return nil, err
+	}
+	if taken > 0 {
+		return nil, fmt.Errorf("%w: another account is named %s or has email %s", ErrScimConflict, req.UserName, email)
+	}
+
+	active := req.Active == nil || *req.Active
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"username":     req.UserName,
+			"email":        email,
+			"display_name": scimDisplayName(req),
+			"is_active":    active,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if req.ExternalID != "" && req.ExternalID != identity.Subject {
+			return tx.Model(identity).Update("subject", req.ExternalID).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		s.logger.Info("SCIM deactivated user", zap.String("userId", user.ID.String()), zap.String("username", req.UserName))
+	}
+	return s.GetUser(id)
+}
+
+// PatchUser applies a SCIM PATCH to a provisioned user. Attributes the platform
+// does not store are ignored.
+func (s *ScimService) PatchUser(id string, req *model.ScimPatchRequest) (*model.ScimUser, error) {
+	current, err := s.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range req.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+		case "remove":
+			// Every stored attribute is required, so there is nothing to remove
+			continue
+		default:
+			return nil, fmt.Errorf("%w: unsupported patch op %q", ErrScimInvalid, op.Op)
+		}
+
+		if op.Path != "" {
+			if err := applyScimUserAttribute(current, op.Path, op.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return nil, fmt.Errorf("%w: patch value without a path must be an object", ErrScimInvalid)
+		}
+		for attr, value := range values {
+			if err := applyScimUserAttribute(current, attr, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s.ReplaceUser(id, current)
+}
+
+// DeleteUser deprovisions a user. The account is deactivated rather than deleted,
+// so its audit history is kept, and it leaves its groups.
+func (s *ScimService) DeleteUser(id string) error {
+	user, identity, err := s.provisionedUser(id)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("is_active", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&model.DirectoryGroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(identity).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.syncUserRoles(user.ID); err != nil {
+		return err
+	}
+
+	s.logger.Info("SCIM deprovisioned user", zap.String("userId", user.ID.String()), zap.String("username", user.Username))
+	return nil
+}
+
+// provisionedUser finds a user provisioned through SCIM by its ID
+func (s *ScimService) provisionedUser(id string) (*model.User, *model.UserIdentity, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, nil, ErrScimNotFound
+	}
+	var identity model.UserIdentity
+	err = s.db.Where("user_id = ? AND provider = ?", userID, model.IdentityProviderSCIM).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrScimNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrScimNotFound
+		}
+		return nil, nil, err
+	}
+	return &user, &identity, nil
+}
+
+func (s *ScimService) hasScimIdentity(userID uuid.UUID) bool {
+	var count int64
+	s.db.Model(&model.UserIdentity{}).Where("user_id = ? AND provider = ?", userID, model.IdentityProviderSCIM).Count(&count)
+	return count > 0
+}
+
+func (s *ScimService) scimUser(user *model.User) (*model.ScimUser, error) {
+	var identity model.UserIdentity
+	if err := s.db.Where("user_id = ? AND provider = ?", user.ID, model.IdentityProviderSCIM).First(&identity).Error; err != nil &&
+		!errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	var groups []model.DirectoryGroup
+	if err := s.db.Joins("JOIN directory_group_members ON directory_group_members.group_id = directory_groups.id").
+		Where("directory_group_members.user_id = ?", user.ID).
+		Order("directory_groups.display_name").
+		Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	active := user.IsActive
+	resource := &model.ScimUser{
+		Schemas:     []string{model.ScimSchemaUser},
+		ID:          user.ID.String(),
+		ExternalID:  identity.Subject,
+		UserName:    user.Username,
+		DisplayName: user.DisplayName,
+		Name:        &model.ScimName{Formatted: user.DisplayName},
+		Emails:      []model.ScimMultiValue{{Value: user.Email, Primary: true}},
+		Active:      &active,
+		Groups:      make([]model.ScimMultiValue, 0, len(groups)),
+		Meta: &model.ScimMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     "/scim/v2/Users/" + user.ID.String(),
+		},
+	}
+	for _, group := range groups {
+		resource.Groups = append(resource.Groups, model.ScimMultiValue{
+			Value:   group.ID.String(),
+			Display: group.DisplayName,
+			Ref:     "/scim/v2/Groups/" + group.ID.String(),
+		})
+	}
+	return resource, nil
+}
+
+// applyScimUserAttribute sets one attribute of a user from a PATCH value
+func applyScimUserAttribute(user *model.ScimUser, attr string, raw json.RawMessage) error {
+	attr = strings.ToLower(attr)
+	if i := strings.LastIndex(attr, ":"); i >= 0 {
+		// Strip a schema URN prefix
+		attr = attr[i+1:]
+	}
+
+	var text string
+	json.Unmarshal(raw, &text)
+	switch {
+	case attr == "active":
+		active, err := scimBool(raw)
+		if err != nil {
+			return err
+		}
+		user.Active = &active
+	case attr == "username":
+		user.UserName = text
+	case attr == "displayname", attr == "name.formatted":
+		user.DisplayName = text
+	case attr == "externalid":
+		user.ExternalID = text
+	case attr == "emails":
+		var emails []model.ScimMultiValue
+		if err := json.Unmarshal(raw, &emails); err != nil {
+			return fmt.Errorf("%w: emails must be a list", ErrScimInvalid)
+		}
+		user.Emails = emails
+	case strings.HasPrefix(attr, "emails[") && strings.HasSuffix(attr, "].value"):
+		user.Emails = []model.ScimMultiValue{{Value: text, Primary: true}}
+	case attr == "name":
+		var name model.ScimName
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return fmt.Errorf("%w: name must be an object", ErrScimInvalid)
+		}
+		user.Name = &name
+		user.DisplayName = scimDisplayName(user)
+	}
+	return nil
+}
+
+// scimBool reads a boolean, which some providers send as a string
+func scimBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		switch strings.ToLower(text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("%w: active must be a boolean", ErrScimInvalid)
+}
+
+// scimEmail returns the primary email of a SCIM user, falling back to the first
+// email, a userName that is an email, or a placeholder
+func scimEmail(user *model.ScimUser) string {
+	for _, email := range user.Emails {
+		if email.Primary && email.Value != "" {
+			return email.Value
+		}
+	}
+	for _, email := range user.Emails {
+		if email.Value != "" {
+			return email.Value
+		}
+	}
+	if strings.Contains(user.UserName, "@") {
+		return user.UserName
+	}
+	return user.UserName + "@scim.local"
+}
+
+func scimDisplayName(user *model.ScimUser) string {
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	if user.Name != nil {
+		if user.Name.Formatted != "" {
+			return user.Name.Formatted
+		}
+		if name := strings.TrimSpace(user.Name.GivenName + " " + user.Name.FamilyName); name != "" {
+			return name
+		}
+	}
+	return user.UserName
+}
+
+// ============== Groups ==============
+
+// ListGroups lists groups, optionally matching an equality filter on displayName
+// or externalId. startIndex is 1-based.
+func (s *ScimService) ListGroups(filter string, startIndex, count int) (*model.ScimListResponse, error) {
+	query := s.db.Model(&model.DirectoryGroup{})
+	if filter != "" {
+		attr, value, err := parseScimFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		switch attr {
+		case "displayname":
+			query = query.Where("display_name = ?", value)
+		case "externalid":
+			query = query.Where("external_id = ?", value)
+		default:
+			return nil, fmt.Errorf("%w: filtering on %s is not supported", ErrScimInvalid, attr)
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	startIndex, count = scimPage(startIndex, count)
+	var groups []model.DirectoryGroup
+	if err := query.Order("display_name").Offset(startIndex - 1).Limit(count).Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	resources := make([]model.ScimGroup, 0, len(groups))
+	for i := range groups {
+		resource, err := s.scimGroup(&groups[i])
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, *resource)
+	}
+	return scimList(int(total), startIndex, resources, len(resources)), nil
+}
+
+// GetGroup returns a group with its members
+func (s *ScimService) GetGroup(id string) (*model.ScimGroup, error) {
+	group, err := s.group(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.scimGroup(group)
+}
+
+// CreateGroup creates a group and gives its members the roles it maps to
+func (s *ScimService) CreateGroup(req *model.ScimGroup) (*model.ScimGroup, error) {
+	if strings.TrimSpace(req.DisplayName) == "" {
+		return nil, fmt.Errorf("%w: displayName is required", ErrScimInvalid)
+	}
+	var taken int64
+	if err := s.db.Model(&model.DirectoryGroup{}).Where("display_name = ?", req.DisplayName).Count(&taken).Error; err != nil {
+		return nil, err
+	}
+	if taken > 0 {
+		return nil, fmt.Errorf("%w: a group named %s exists", ErrScimConflict, req.DisplayName)
+	}
+
+	group := model.DirectoryGroup{ID: uuid.New(), ExternalID: req.ExternalID, DisplayName: req.DisplayName}
+	members := s.memberIDs(req.Members)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		return addGroupMembers(tx, group.ID, members)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.syncUsersRoles(members); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("SCIM created group", zap.String("groupId", group.ID.String()), zap.String("name", group.DisplayName),
+		zap.Int("members", len(members)))
+	return s.scimGroup(&group)
+}
+
+// ReplaceGroup replaces a group's name and members
+func (s *ScimService) ReplaceGroup(id string, req *model.ScimGroup) (*model.ScimGroup, error) {
+	group, err := s.group(id)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.DisplayName) == "" {
+		return nil, fmt.Errorf("%w: displayName is required", ErrScimInvalid)
+	}
+	before, err := s.groupMemberIDs(group.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.renameGroup(group, req.DisplayName, req.ExternalID); err != nil {
+		return nil, err
+	}
+
+	members := s.memberIDs(req.Members)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&model.DirectoryGroupMember{}).Error; err != nil {
+			return err
+		}
+		return addGroupMembers(tx, group.ID, members)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.syncUsersRoles(append(before, members...)); err != nil {
+		return nil, err
+	}
+	return s.scimGroup(group)
+}
+
+// PatchGroup applies a SCIM PATCH to a group: renames and member additions and
+// removals
+func (s *ScimService) PatchGroup(id string, req *model.ScimPatchRequest) (*model.ScimGroup, error) {
+	group, err := s.group(id)
+	if err != nil {
+		return nil, err
+	}
+	before, err := s.groupMemberIDs(group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range req.Operations {
+		path := strings.ToLower(op.Path)
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			if path == "" {
+				var values struct {
+					DisplayName string                 `json:"displayName"`
+					ExternalID  string                 `json:"externalId"`
+					Members     []model.ScimMultiValue `json:"members"`
+				}
+				if err := json.Unmarshal(op.Value, &values); err != nil {
+					return nil, fmt.Errorf("%w: patch value without a path must be an object", ErrScimInvalid)
+				}
+				if values.DisplayName != "" || values.ExternalID != "" {
+					if err := s.renameGroup(group, values.DisplayName, values.ExternalID); err != nil {
+						return nil, err
+					}
+				}
+				if values.Members != nil {
+					if err := s.patchMembers(group.ID, strings.ToLower(op.Op) == "replace", values.Members); err != nil {
+						return nil, err
+					}
+				}
+				continue
+			}
+			switch path {
+			case "displayname", "externalid":
+				var text string
+				if err := json.Unmarshal(op.Value, &text); err != nil {
+					return nil, fmt.Errorf("%w: %s must be a string", ErrScimInvalid, op.Path)
+				}
+				name, externalID := "", text
+				if path == "displayname" {
+					name, externalID = text, ""
+				}
+				if err := s.renameGroup(group, name, externalID); err != nil {
+					return nil, err
+				}
+			case "members":
+				var members []model.ScimMultiValue
+				if err := json.Unmarshal(op.Value, &members); err != nil {
+					return nil, fmt.Errorf("%w: members must be a list", ErrScimInvalid)
+				}
+				if err := s.patchMembers(group.ID, strings.ToLower(op.Op) == "replace", members); err != nil {
+					return nil, err
+				}
+			}
+		case "remove":
+			if err := s.removeMembers(group.ID, op); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: unsupported patch op %q", ErrScimInvalid, op.Op)
+		}
+	}
+
+	after, err := s.groupMemberIDs(group.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.syncUsersRoles(append(before, after...)); err != nil {
+		return nil, err
+	}
+	return s.scimGroup(group)
+}
+
+// DeleteGroup deletes a group and takes away the roles it gave its members
+func (s *ScimService) DeleteGroup(id string) error {
+	group, err := s.group(id)
+	if err != nil {
+		return err
+	}
+	members, err := s.groupMemberIDs(group.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&model.DirectoryGroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.syncUsersRoles(members); err != nil {
+		return err
+	}
+
+	s.logger.Info("SCIM deleted group", zap.String("groupId", group.ID.String()), zap.String("name", group.DisplayName))
+	return nil
+}
+
+// renameGroup changes a group's display name and external ID; empty values are kept
+func (s *ScimService) renameGroup(group *model.DirectoryGroup, displayName, externalID string) error {
+	updates := make(map[string]interface{})
+	if displayName != "" && displayName != group.DisplayName {
+		var taken int64
+		if err := s.db.Model(&model.DirectoryGroup{}).
+			Where("id <> ? AND display_name = ?", group.ID, displayName).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return fmt.Errorf("%w: a group named %s exists", ErrScimConflict, displayName)
+		}
+		updates["display_name"] = displayName
+		group.DisplayName = displayName
+	}
+	if externalID != "" && externalID != group.ExternalID {
+		updates["external_id"] = externalID
+		group.ExternalID = externalID
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return s.db.Model(group).Updates(updates).Error
+}
+
+// patchMembers adds members to a group, or with replace makes them its only members
+func (s *ScimService) patchMembers(groupID uuid.UUID, replace bool, members []model.ScimMultiValue) error {
+	ids := s.memberIDs(members)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if replace {
+			if err := tx.Where("group_id = ?", groupID).Delete(&model.DirectoryGroupMember{}).Error; err != nil {
+				return err
+			}
+		}
+		return addGroupMembers(tx, groupID, ids)
+	})
+}
+
+// removeMembers handles a remove op, which names members either in a path filter
+// such as members[value eq "id"] or in its value. Without either it removes all.
+func (s *ScimService) removeMembers(groupID uuid.UUID, op model.ScimPatchOperation) error {
+	path := strings.TrimSpace(op.Path)
+	if !strings.HasPrefix(strings.ToLower(path), "members") {
+		return nil
+	}
+
+	var ids []uuid.UUID
+	if open, end := strings.Index(path, "["), strings.LastIndex(path, "]"); open >= 0 && end > open {
+		attr, value, err := parseScimFilter(path[open+1 : end])
+		if err != nil || attr != "value" {
+			return fmt.Errorf("%w: unsupported member filter %q", ErrScimInvalid, path)
+		}
+		if id, err := uuid.Parse(value); err == nil {
+			ids = append(ids, id)
+		}
+	} else if len(op.Value) > 0 {
+		var members []model.ScimMultiValue
+		if err := json.Unmarshal(op.Value, &members); err != nil {
+			return fmt.Errorf("%w: members must be a list", ErrScimInvalid)
+		}
+		for _, member := range members {
+			if id, err := uuid.Parse(member.Value); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	} else {
+		return s.db.Where("group_id = ?", groupID).Delete(&model.DirectoryGroupMember{}).Error
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.db.Where("group_id = ? AND user_id IN ?", groupID, ids).Delete(&model.DirectoryGroupMember{}).Error
+}
+
+func (s *ScimService) group(id string) (*model.DirectoryGroup, error) {
+	groupID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrScimNotFound
+	}
+	var group model.DirectoryGroup
+	if err := s.db.Where("id = ?", groupID).First(&group).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrScimNotFound
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (s *ScimService) groupMemberIDs(groupID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := s.db.Model(&model.DirectoryGroupMember{}).Where("group_id = ?", groupID).Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// memberIDs returns the IDs of the provisioned users among members. Unknown members
+// are skipped, since providers may push groups before all their users.
+func (s *ScimService) memberIDs(members []model.ScimMultiValue) []uuid.UUID {
+	candidates := make([]uuid.UUID, 0, len(members))
+	for _, member := range members {
+		if id, err := uuid.Parse(member.Value); err == nil {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var ids []uuid.UUID
+	s.db.Model(&model.UserIdentity{}).
+		Where("provider = ? AND user_id IN ?", model.IdentityProviderSCIM, candidates).
+		Distinct().Pluck("user_id", &ids)
+	if len(ids) < len(candidates) {
+		s.logger.Warn("SCIM group names unknown members", zap.Int("members", len(candidates)), zap.Int("known", len(ids)))
+	}
+	return ids
+}
+
+func addGroupMembers(tx *gorm.DB, groupID uuid.UUID, userIDs []uuid.UUID) error {
+	for _, userID := range userIDs {
+		member := model.DirectoryGroupMember{GroupID: groupID, UserID: userID}
+		if err := tx.Where(member).FirstOrCreate(&member).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ScimService) scimGroup(group *model.DirectoryGroup) (*model.ScimGroup, error) {
+	var users []model.User
+	if err := s.db.Joins("JOIN directory_group_members ON directory_group_members.user_id = users.id").
+		Where("directory_group_members.group_id = ?", group.ID).
+		Order("users.username").
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	resource := &model.ScimGroup{
+		Schemas:     []string{model.ScimSchemaGroup},
+		ID:          group.ID.String(),
+		ExternalID:  group.ExternalID,
+		DisplayName: group.DisplayName,
+		Members:     make([]model.ScimMultiValue, 0, len(users)),
+		Meta: &model.ScimMeta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     "/scim/v2/Groups/" + group.ID.String(),
+		},
+	}
+	for _, user := range users {
+		resource.Members = append(resource.Members, model.ScimMultiValue{
+			Value:   user.ID.String(),
+			Display: user.Username,
+			Ref:     "/scim/v2/Users/" + user.ID.String(),
+		})
+	}
+	return resource, nil
+}
+
+// ============== Roles ==============
+
+// syncUsersRoles re-syncs the roles of each distinct user
+func (s *ScimService) syncUsersRoles(userIDs []uuid.UUID) error {
+	seen := make(map[uuid.UUID]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		if err := s.syncUserRoles(userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncUserRoles gives a user the roles of the directory groups they are in
+func (s *ScimService) syncUserRoles(userID uuid.UUID) error {
+	var groups []string
+	if err := s.db.Model(&model.DirectoryGroup{}).
+		Joins("JOIN directory_group_members ON directory_group_members.group_id = directory_groups.id").
+		Where("directory_group_members.user_id = ?", userID).
+		Pluck("directory_groups.display_name", &groups).Error; err != nil {
+		return err
+	}
+	return s.sso.SyncGroupRoles(userID, groups)
+}
+
+// ============== Helpers ==============
+
+// parseScimFilter parses an equality filter, returning the lowercased attribute
+func parseScimFilter(filter string) (string, string, error) {
+	m := scimFilterPattern.FindStringSubmatch(filter)
+	if m == nil {
+		return "", "", fmt.Errorf("%w: only filters of the form attribute eq \"value\" are supported", ErrScimInvalid)
+	}
+	value := strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(m[2])
+	return strings.ToLower(m[1]), value, nil
+}
+
+func scimPage(startIndex, count int) (int, int) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count <= 0 || count > maxScimPageSize {
+		count = maxScimPageSize
+	}
+	return startIndex, count
+}
+
+func scimList(total, startIndex int, resources interface{}, n int) *model.ScimListResponse {
+	return &model.ScimListResponse{
+		Schemas:      []string{model.ScimSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: n,
+		Resources:    resources,
+	}
+}
@@ -0,0 +1,604 @@
+// Package service provides the global search across the inventory
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// searchIndexInterval is how often the pods and deployments of every cluster
+	// are indexed
+	searchIndexInterval = 2 * time.Minute
+	// searchIndexTimeout bounds indexing one cluster
+	searchIndexTimeout = 30 * time.Second
+	// defaultSearchLimit and maxSearchLimit bound the results of each type
+	defaultSearchLimit = 5
+	maxSearchLimit     = 50
+	// minSearchQuery is the shortest name query searched; shorter ones match
+	// too much to be useful while typing
+	minSearchQuery = 2
+)
+
+// Scores of a name match, best first
+const (
+	searchScoreExact  = 100
+	searchScorePrefix = 50
+	searchScoreWord   = 30 // the query starts a word of the name, e.g. "api" in "payments-api"
+	searchScoreSubstr = 10
+)
+
+// searchEntry is an indexed pod or deployment
+type searchEntry struct {
+	kind      model.SearchResultType
+	name      string
+	lower     string
+	namespace string
+	status    string
+	labels    map[string]string
+}
+
+// searchIndex holds the pods and deployments of a cluster
+type searchIndex struct {
+	entries []searchEntry
+}
+
+// searchQuery is a parsed search: a name, or a label key and value
+type searchQuery struct {
+	text        string // lower case name query
+	labelKey    string
+	labelValue  string // lower case
+	labelPrefix bool   // the value ended in *
+}
+
+// isLabel reports whether the query matches labels rather than names
+func (q *searchQuery) isLabel() bool {
+	return q.labelKey != ""
+}
+
+// SearchService searches hosts, clusters, pods, deployments, dashboards, alert
+// rules and Helm releases by name or label. Database resources are matched with
+// trigram indexes; pods and deployments, which live in the clusters, are matched
+// against an index of every cluster rebuilt in the background so typing never
+// waits on a cluster.
+type SearchService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	fanout *ClusterFanoutService
+
+	mu      sync.RWMutex
+	indexes map[uuid.UUID]*searchIndex // by cluster
+}
+
+// NewSearchService creates a new search service. Cluster access is decided as for
+// fan-out queries.
+func NewSearchService(db *gorm.DB, logger *zap.Logger, fanout *ClusterFanoutService) *SearchService {
+	return &SearchService{
+		db:      db,
+		logger:  logger,
+		fanout:  fanout,
+		indexes: make(map[uuid.UUID]*searchIndex),
+	}
+}
+
+// Run indexes every cluster right away and then every searchIndexInterval until
+// ctx is cancelled
+func (s *SearchService) Run(ctx context.Context) {
+	s.RefreshAll(ctx)
+
+	ticker := time.NewTicker(searchIndexInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.RefreshAll(ctx)
+		}
+	}
+}
+
+// RefreshAll indexes every cluster and drops the indexes of deleted clusters
+func (s *SearchService) RefreshAll(ctx context.Context) {
+	var clusters []model.K8sCluster
+	if err := s.db.Where("status <> ?", model.ClusterStatusDisabled).Find(&clusters).Error; err != nil {
+		s.logger.Error("failed to list clusters for the search index", zap.Error(err))
+		return
+	}
+
+	slots := make(chan struct{}, fanoutConcurrency)
+	var wg sync.WaitGroup
+	for i := range clusters {
+		wg.Add(1)
+		go func(cluster *model.K8sCluster) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			index, err := s.buildIndex(ctx, cluster)
+			if err != nil {
+				// The last index is kept so a blip does not empty the results
+				s.logger.Warn("failed to index cluster for search", zap.String("cluster", cluster.Name), zap.Error(err))
+				return
+			}
+			s.mu.Lock()
+			s.indexes[cluster.ID] = index
+			s.mu.Unlock()
+		}(&clusters[i])
+	}
+	wg.Wait()
+
+	current := make(map[uuid.UUID]bool, len(clusters))
+	for _, cluster := range clusters {
+		current[cluster.ID] = true
+	}
+	s.mu.Lock()
+	for id := range s.indexes {
+		if !current[id] {
+			delete(s.indexes, id)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// buildIndex lists the pods and deployments of a cluster
+func (s *SearchService) buildIndex(ctx context.Context, cluster *model.K8sCluster) (*searchIndex, error) {
+	ctx, cancel := context.WithTimeout(ctx, searchIndexTimeout)
+	defer cancel()
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	pods, err := client.GetPods(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	deployments, err := client.GetDeployments(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	index := &searchIndex{entries: make([]searchEntry, 0, len(pods)+len(deployments))}
+	for _, pod := range pods {
+		index.entries = append(index.entries, searchEntry{
+			kind:      model.SearchResultPod,
+			name:      pod.Name,
+			lower:     strings.ToLower(pod.Name),
+			namespace: pod.Namespace,
+			status:    pod.Status,
+			labels:    pod.Labels,
+		})
+	}
+	for _, deployment := range deployments {
+		index.entries = append(index.entries, searchEntry{
+			kind:      model.SearchResultDeployment,
+			name:      deployment.Name,
+			lower:     strings.ToLower(deployment.Name),
+			namespace: deployment.Namespace,
+			status:    fmt.Sprintf("%d/%d ready", deployment.ReadyReplicas, deployment.Replicas),
+			labels:    deployment.Labels,
+		})
+	}
+	return index, nil
+}
+
+// Search returns the resources the user may see that match the query, at most
+// req.Limit of each type
+func (s *SearchService) Search(ctx context.Context, userID uuid.UUID, req *model.SearchRequest) (*model.SearchResponse, error) {
+	started := time.Now()
+	response := &model.SearchResponse{Query: req.Query, Results: []model.SearchResult{}}
+	query := parseSearchQuery(req.Query)
+	if !query.isLabel() && len([]rune(query.text)) < minSearchQuery {
+		return response, nil
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	wanted := make(map[model.SearchResultType]bool)
+	for _, t := range req.Types {
+		wanted[t] = true
+	}
+	want := func(t model.SearchResultType) bool {
+		return len(wanted) == 0 || wanted[t]
+	}
+
+	// Clusters are needed for their own results and to scope pods, deployments
+	// and releases
+	var targets []fanoutTarget
+	if want(model.SearchResultCluster) || want(model.SearchResultPod) || want(model.SearchResultDeployment) || want(model.SearchResultHelmRelease) {
+		all, err := s.fanout.targets(userID, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, target := range all {
+			if target.err == nil {
+				targets = append(targets, target)
+			}
+		}
+	}
+
+	db := s.db.WithContext(ctx)
+	for _, t := range model.SearchResultTypes {
+		if !want(t) {
+			continue
+		}
+		var results []model.SearchResult
+		var err error
+		switch t {
+		case model.SearchResultHost:
+			if model.UserHasPermission(s.db, userID, "hosts", "list", nil, "").Allowed {
+				results, err = searchHosts(db, &query, limit)
+			}
+		case model.SearchResultCluster:
+			results = searchClusters(targets, &query)
+		case model.SearchResultPod, model.SearchResultDeployment:
+			var indexing bool
+			results, indexing = s.searchWorkloads(targets, t, &query)
+			response.Indexing = response.Indexing || indexing
+		case model.SearchResultHelmRelease:
+			results, err = searchHelmReleases(db, userID, targets, &query, limit)
+		case model.SearchResultDashboard:
+			results, err = searchDashboards(db, userID, &query, limit)
+		case model.SearchResultAlertRule:
+			results, err = searchAlertRules(db, userID, &query, limit)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %ss: %w", t, err)
+		}
+
+		sort.SliceStable(results, func(i, j int) bool {
+			if results[i].Score != results[j].Score {
+				return results[i].Score > results[j].Score
+			}
+			if len(results[i].Name) != len(results[j].Name) {
+				return len(results[i].Name) < len(results[j].Name)
+			}
+			return results[i].Name < results[j].Name
+		})
+		if len(results) > limit {
+			results = results[:limit]
+		}
+		response.Results = append(response.Results, results...)
+	}
+
+	response.Took = time.Since(started).Milliseconds()
+	return response, nil
+}
+
+// searchWorkloads matches the indexed pods or deployments of the clusters and
+// namespaces the user may see. It reports whether a cluster has not been indexed
+// yet.
+func (s *SearchService) searchWorkloads(targets []fanoutTarget, kind model.SearchResultType, query *searchQuery) ([]model.SearchResult, bool) {
+	results := []model.SearchResult{}
+	indexing := false
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := range targets {
+		target := &targets[i]
+		index := s.indexes[target.cluster.ID]
+		if index == nil {
+			indexing = indexing || target.cluster.Status != model.ClusterStatusDisabled
+			continue
+		}
+		clusterID := target.cluster.ID
+		for j := range index.entries {
+			entry := &index.entries[j]
+			if entry.kind != kind || (target.visible != nil && !target.visible[entry.namespace]) {
+				continue
+			}
+			score, label := query.matchEntry(entry)
+			if score == 0 {
+				continue
+			}
+			result := model.SearchResult{
+				Type:        kind,
+				ID:          entry.namespace + "/" + entry.name,
+				Name:        entry.name,
+				ClusterID:   &clusterID,
+				ClusterName: target.cluster.Name,
+				Namespace:   entry.namespace,
+				Status:      entry.status,
+				Label:       label,
+				Score:       score,
+			}
+			if kind == model.SearchResultPod {
+				result.Link = fmt.Sprintf("/clusters/%s/namespaces/%s/pods/%s", clusterID, url.PathEscape(entry.namespace), url.PathEscape(entry.name))
+			} else {
+				result.Link = fmt.Sprintf("/clusters/%s/workloads?tab=deployments&namespace=%s", clusterID, url.QueryEscape(entry.namespace))
+			}
+			results = append(results, result)
+		}
+	}
+	return results, indexing
+}
+
+// searchClusters matches the names of the clusters the user may see
+func searchClusters(targets []fanoutTarget, query *searchQuery) []model.SearchResult {
+	results := []model.SearchResult{}
+	if query.isLabel() {
+		return results
+	}
+	for _, target := range targets {
+		score := query.matchName(target.cluster.Name)
+		if score == 0 {
+			continue
+		}
+		clusterID := target.cluster.ID
+		results = append(results, model.SearchResult{
+			Type:        model.SearchResultCluster,
+			ID:          clusterID.String(),
+			Name:        target.cluster.Name,
+			Description: joinNonEmpty(" · ", target.cluster.Provider, target.cluster.Region, target.cluster.Version),
+			ClusterID:   &clusterID,
+			ClusterName: target.cluster.Name,
+			Status:      string(target.cluster.Status),
+			Link:        "/clusters/" + clusterID.String(),
+			Score:       score,
+		})
+	}
+	return results
+}
+
+// searchHosts matches host names and addresses, or host labels
+func searchHosts(db *gorm.DB, query *searchQuery, limit int) ([]model.SearchResult, error) {
+	q := db.Model(&model.Host{}).Select("id, hostname, ip_address, status, os_type, labels")
+	if query.isLabel() {
+		q = q.Where("labels->>? ILIKE ?", query.labelKey, query.labelPattern())
+	} else {
+		pattern := sanitize.Contains(query.text)
+		q = q.Where("hostname ILIKE ? OR host(ip_address) LIKE ?", pattern, pattern)
+	}
+	var hosts []model.Host
+	if err := query.order(q, "hostname").Limit(limit).Find(&hosts).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]model.SearchResult, 0, len(hosts))
+	for _, host := range hosts {
+		result := model.SearchResult{
+			Type:        model.SearchResultHost,
+			ID:          host.ID.String(),
+			Name:        host.Hostname,
+			Description: joinNonEmpty(" · ", host.IPAddress, host.OSType),
+			Status:      string(host.Status),
+			Link:        "/hosts/" + host.ID.String(),
+		}
+		if query.isLabel() {
+			result.Label = query.labelKey + "=" + host.Labels[query.labelKey]
+			result.Score = searchScoreExact
+		} else {
+			result.Score = query.matchName(host.Hostname)
+			if result.Score == 0 {
+				// Matched by address
+				result.Score = query.matchName(host.IPAddress)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// searchHelmReleases matches the names of the user's releases on clusters they
+// may still see
+func searchHelmReleases(db *gorm.DB, userID uuid.UUID, targets []fanoutTarget, query *searchQuery, limit int) ([]model.SearchResult, error) {
+	results := []model.SearchResult{}
+	if query.isLabel() {
+		return results, nil
+	}
+	clusters := make(map[uuid.UUID]*fanoutTarget, len(targets))
+	for i := range targets {
+		clusters[targets[i].cluster.ID] = &targets[i]
+	}
+
+	q := db.Model(&model.HelmRelease{}).Select("id, cluster_id, namespace, name, status, chart, chart_version").
+		Where("user_id = ? AND name ILIKE ?", userID, sanitize.Contains(query.text))
+	var releases []model.HelmRelease
+	if err := query.order(q, "name").Limit(limit).Find(&releases).Error; err != nil {
+		return nil, err
+	}
+	for _, release := range releases {
+		target := clusters[release.ClusterID]
+		if target == nil || (target.visible != nil && !target.visible[release.Namespace]) {
+			continue
+		}
+		clusterID := release.ClusterID
+		results = append(results, model.SearchResult{
+			Type:        model.SearchResultHelmRelease,
+			ID:          release.ID.String(),
+			Name:        release.Name,
+			Description: joinNonEmpty("-", release.Chart, release.ChartVersion),
+			ClusterID:   &clusterID,
+			ClusterName: target.cluster.Name,
+			Namespace:   release.Namespace,
+			Status:      string(release.Status),
+			Link:        "/helm/applications",
+			Score:       query.matchName(release.Name),
+		})
+	}
+	return results, nil
+}
+
+// searchDashboards matches the titles of the user's synced Grafana dashboards,
+// linking to them in Grafana
+func searchDashboards(db *gorm.DB, userID uuid.UUID, query *searchQuery, limit int) ([]model.SearchResult, error) {
+	results := []model.SearchResult{}
+	if query.isLabel() {
+		return results, nil
+	}
+
+	var rows []struct {
+		ID          uuid.UUID
+		Title       string
+		GrafanaUID  string
+		Slug        string
+		FolderTitle string
+		URL         string
+	}
+	q := db.Table("grafana_dashboards d").
+		Select("d.id, d.title, d.grafana_uid, d.slug, d.folder_title, i.url").
+		Joins("JOIN grafana_instances i ON i.id = d.instance_id").
+		Where("d.user_id = ? AND d.title ILIKE ?", userID, sanitize.Contains(query.text))
+	if err := query.order(q, "d.title").Limit(limit).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		results = append(results, model.SearchResult{
+			Type:        model.SearchResultDashboard,
+			ID:          row.ID.String(),
+			Name:        row.Title,
+			Description: row.FolderTitle,
+			Link:        strings.TrimRight(row.URL, "/") + "/d/" + url.PathEscape(row.GrafanaUID) + "/" + url.PathEscape(row.Slug),
+			External:    true,
+			Score:       query.matchName(row.Title),
+		})
+	}
+	return results, nil
+}
+
+// searchAlertRules matches the names of the user's alert rules
+func searchAlertRules(db *gorm.DB, userID uuid.UUID, query *searchQuery, limit int) ([]model.SearchResult, error) {
+	results := []model.SearchResult{}
+	if query.isLabel() {
+		return results, nil
+	}
+
+	q := db.Model(&model.AlertRule{}).Select("id, name, enabled, metric_type, severity").
+		Where("user_id = ? AND name ILIKE ?", userID, sanitize.Contains(query.text))
+	var rules []model.AlertRule
+	if err := query.order(q, "name").Limit(limit).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		status := "enabled"
+		if !rule.Enabled {
+			status = "disabled"
+		}
+		results = append(results, model.SearchResult{
+			Type:        model.SearchResultAlertRule,
+			ID:          rule.ID.String(),
+			Name:        rule.Name,
+			Description: joinNonEmpty(" · ", rule.MetricType, string(rule.Severity)),
+			Status:      status,
+			Link:        "/alerts?tab=rules",
+			Score:       query.matchName(rule.Name),
+		})
+	}
+	return results, nil
+}
+
+// parseSearchQuery reads a name query, or a label query of the form key=value
+func parseSearchQuery(raw string) searchQuery {
+	raw = strings.TrimSpace(raw)
+	if key, value, ok := strings.Cut(raw, "="); ok && strings.TrimSpace(key) != "" {
+		query := searchQuery{labelKey: strings.TrimSpace(key), labelValue: strings.ToLower(strings.TrimSpace(value))}
+		if strings.HasSuffix(query.labelValue, "*") {
+			query.labelValue, query.labelPrefix = strings.TrimSuffix(query.labelValue, "*"), true
+		}
+		return query
+	}
+	return searchQuery{text: strings.ToLower(raw)}
+}
+
+// labelPattern is the ILIKE pattern of the label value
+func (q *searchQuery) labelPattern() string {
+	if q.labelPrefix {
+		return sanitize.EscapeLike(q.labelValue) + "%"
+	}
+	return sanitize.EscapeLike(q.labelValue)
+}
+
+// order sorts a name query's rows exact match first, then prefix matches, then
+// shorter names, so the rows the limit keeps are the best ones
+func (q *searchQuery) order(db *gorm.DB, column string) *gorm.DB {
+	if q.isLabel() {
+		return db.Order(column)
+	}
+	return db.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:                fmt.Sprintf("lower(%s) = ? DESC, %s ILIKE ? DESC, length(%s), %s", column, column, column, column),
+		Vars:               []interface{}{q.text, sanitize.EscapeLike(q.text) + "%"},
+		WithoutParentheses: true,
+	}})
+}
+
+// matchName scores a name against a name query; 0 is no match
+func (q *searchQuery) matchName(name string) int {
+	lower := strings.ToLower(name)
+	switch {
+	case q.text == "":
+		return 0
+	case lower == q.text:
+		return searchScoreExact
+	case strings.HasPrefix(lower, q.text):
+		return searchScorePrefix
+	}
+	i := strings.Index(lower, q.text)
+	if i < 0 {
+		return 0
+	}
+	for ; i >= 0; i = indexFrom(lower, q.text, i+1) {
+		if strings.ContainsRune("-_./ ", rune(lower[i-1])) {
+			return searchScoreWord
+		}
+	}
+	return searchScoreSubstr
+}
+
+// matchEntry scores an indexed pod or deployment, returning the label that
+// matched for label queries
+func (q *searchQuery) matchEntry(entry *searchEntry) (int, string) {
+	if !q.isLabel() {
+		return q.matchName(entry.lower), ""
+	}
+	value, ok := entry.labels[q.labelKey]
+	if !ok {
+		return 0, ""
+	}
+	lower := strings.ToLower(value)
+	if lower == q.labelValue || (q.labelPrefix && strings.HasPrefix(lower, q.labelValue)) {
+		return searchScoreExact, q.labelKey + "=" + value
+	}
+	return 0, ""
+}
+
+// indexFrom is strings.Index of substr in s starting at from, or -1
+func indexFrom(s, substr string, from int) int {
+	if from >= len(s) {
+		return -1
+	}
+	i := strings.Index(s[from:], substr)
+	if i < 0 {
+		return -1
+	}
+	return from + i
+}
+
+// joinNonEmpty joins the non-empty parts with sep
+func joinNonEmpty(sep string, parts ...string) string {
+	kept := parts[:0:0]
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, sep)
+}
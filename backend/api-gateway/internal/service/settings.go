@@ -0,0 +1,352 @@
+// Package service provides runtime-tunable settings backed by the database
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errors returned when changing settings
+var (
+	ErrUnknownSetting = errors.New("unknown setting")
+	ErrInvalidSetting = errors.New("invalid setting value")
+)
+
+// secretSettingMask replaces secret values in API responses
+const secretSettingMask = "********"
+
+// SettingsWatcher is called with a setting's new effective value after it changes
+type SettingsWatcher func(key, value string)
+
+// SettingsService caches the stored setting overrides and serves typed values.
+// Overrides are reloaded periodically, so changes made through another gateway
+// instance are picked up and announced to watchers here too.
+type SettingsService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	defaults map[string]string
+	stored   map[string]model.Setting
+	watchers map[string][]SettingsWatcher
+}
+
+// NewSettingsService creates a new settings service. Call Refresh to load the
+// stored overrides.
+func NewSettingsService(db *gorm.DB, logger *zap.Logger) *SettingsService {
+	defaults := make(map[string]string, len(model.SettingDefinitions))
+	for _, def := range model.SettingDefinitions {
+		defaults[def.Key] = def.Default
+	}
+	return &SettingsService{
+		db:       db,
+		logger:   logger,
+		defaults: defaults,
+		stored:   make(map[string]model.Setting),
+		watchers: make(map[string][]SettingsWatcher),
+	}
+}
+
+// SetDefault replaces the default of a setting, typically with the value from the
+// gateway config
+func (s *SettingsService) SetDefault(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaults[key] = value
+}
+
+// Watch registers fn to be called whenever the effective value of key changes
+func (s *SettingsService) Watch(key string, fn SettingsWatcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchers[key] = append(s.watchers[key], fn)
+}
+
+// Run reloads the stored overrides every interval until ctx is cancelled
+func (s *SettingsService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(); err != nil {
+				s.logger.Error("failed to refresh settings", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Refresh reloads the stored overrides and notifies watchers of changed values
+func (s *SettingsService) Refresh() error {
+	var settings []model.Setting
+	if err := s.db.Find(&settings).Error; err != nil {
+		return err
+	}
+
+	stored := make(map[string]model.Setting, len(settings))
+	for _, setting := range settings {
+		stored[setting.Key] = setting
+	}
+
+	s.mu.Lock()
+	before := s.effectiveLocked()
+	s.stored = stored
+	after := s.effectiveLocked()
+	s.mu.Unlock()
+
+	for key, value := range after {
+		if before[key] != value {
+			s.notify(key, value)
+		}
+	}
+	return nil
+}
+
+// ============== Typed Accessors ==============
+
+// Value returns the effective value of a setting. A nil service returns the
+// definition's default, so callers need not check for one.
+func (s *SettingsService) Value(key string) string {
+	if s == nil {
+		def, _ := model.LookupSetting(key)
+		return def.Default
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if setting, ok := s.stored[key]; ok {
+		return setting.Value
+	}
+	return s.defaults[key]
+}
+
+// String returns a string setting
+func (s *SettingsService) String(key string) string {
+	return s.Value(key)
+}
+
+// Int returns an int setting, or 0 if it does not parse
+func (s *SettingsService) Int(key string) int {
+	v, _ := strconv.Atoi(s.Value(key))
+	return v
+}
+
+// Float returns a float setting, or 0 if it does not parse
+func (s *SettingsService) Float(key string) float64 {
+	v, _ := strconv.ParseFloat(s.Value(key), 64)
+	return v
+}
+
+// Bool returns a bool setting, or false if it does not parse
+func (s *SettingsService) Bool(key string) bool {
+	v, _ := strconv.ParseBool(s.Value(key))
+	return v
+}
+
+// Duration returns a duration setting, or 0 if it does not parse
+func (s *SettingsService) Duration(key string) time.Duration {
+	v, _ := time.ParseDuration(s.Value(key))
+	return v
+}
+
+// ============== Management ==============
+
+// List returns every setting, optionally only those in category. Secret values are
+// masked.
+func (s *SettingsService) List(category string) []model.SettingResponse {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	responses := make([]model.SettingResponse, 0, len(model.SettingDefinitions))
+	for _, def := range model.SettingDefinitions {
+		if category != "" && def.Category != category {
+			continue
+		}
+		responses = append(responses, s.responseLocked(def))
+	}
+	sort.Slice(responses, func(i, j int) bool {
+		return responses[i].Key < responses[j].Key
+	})
+	return responses
+}
+
+// Get returns one setting with its secret value masked
+func (s *SettingsService) Get(key string) (*model.SettingResponse, error) {
+	def, ok := model.LookupSetting(key)
+	if !ok {
+		return nil, ErrUnknownSetting
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	resp := s.responseLocked(def)
+	return &resp, nil
+}
+
+// Set validates and stores an override of a setting
+func (s *SettingsService) Set(key, value string, userID uuid.UUID) (*model.SettingResponse, error) {
+	def, ok := model.LookupSetting(key)
+	if !ok {
+		return nil, ErrUnknownSetting
+	}
+	value, err := normalizeSettingValue(def, value)
+	if err != nil {
+		return nil, err
+	}
+
+	setting := model.Setting{Key: key, Value: value, UpdatedBy: &userID}
+	err = s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_by", "updated_at"}),
+	}).Create(&setting).Error
+	if err != nil {
+		return nil, err
+	}
+
+	s.apply(key, &setting)
+	s.logger.Info("setting changed", zap.String("key", key), zap.String("userId", userID.String()))
+	return s.Get(key)
+}
+
+// Reset removes the override of a setting so its default applies again
+func (s *SettingsService) Reset(key string, userID uuid.UUID) (*model.SettingResponse, error) {
+	if _, ok := model.LookupSetting(key); !ok {
+		return nil, ErrUnknownSetting
+	}
+	if err := s.db.Where("key = ?", key).Delete(&model.Setting{}).Error; err != nil {
+		return nil, err
+	}
+
+	s.apply(key, nil)
+	s.logger.Info("setting reset", zap.String("key", key), zap.String("userId", userID.String()))
+	return s.Get(key)
+}
+
+// apply updates the cached override of key and notifies watchers if the effective
+// value changed
+func (s *SettingsService) apply(key string, setting *model.Setting) {
+	s.mu.Lock()
+	before := s.valueLocked(key)
+	if setting != nil {
+		s.stored[key] = *setting
+	} else {
+		delete(s.stored, key)
+	}
+	after := s.valueLocked(key)
+	s.mu.Unlock()
+
+	if before != after {
+		s.notify(key, after)
+	}
+}
+
+func (s *SettingsService) notify(key, value string) {
+	s.mu.RLock()
+	watchers := s.watchers[key]
+	s.mu.RUnlock()
+
+	for _, fn := range watchers {
+		fn(key, value)
+	}
+}
+
+func (s *SettingsService) valueLocked(key string) string {
+	if setting, ok := s.stored[key]; ok {
+		return setting.Value
+	}
+	return s.defaults[key]
+}
+
+func (s *SettingsService) effectiveLocked() map[string]string {
+	values := make(map[string]string, len(s.defaults))
+	for key := range s.defaults {
+		values[key] = s.valueLocked(key)
+	}
+	return values
+}
+
+func (s *SettingsService) responseLocked(def model.SettingDefinition) model.SettingResponse {
+	def.Default = s.defaults[def.Key]
+	resp := model.SettingResponse{SettingDefinition: def, Value: def.Default}
+	if setting, ok := s.stored[def.Key]; ok {
+		resp.Value = setting.Value
+		resp.Overridden = true
+		resp.UpdatedBy = setting.UpdatedBy
+		updatedAt := setting.UpdatedAt
+		resp.UpdatedAt = &updatedAt
+	}
+	if def.Secret {
+		if resp.Value != "" {
+			resp.Value = secretSettingMask
+		}
+		if resp.Default != "" {
+			resp.Default = secretSettingMask
+		}
+	}
+	return resp
+}
+
+// normalizeSettingValue checks that value parses as the setting's type and respects
+// its minimum, and returns it in canonical form
+func normalizeSettingValue(def model.SettingDefinition, value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	var number float64
+	switch def.Type {
+	case model.SettingTypeString:
+		return value, nil
+	case model.SettingTypeJSON:
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, []byte(value)); err != nil {
+			return "", fmt.Errorf("%w: %s must be valid JSON", ErrInvalidSetting, def.Key)
+		}
+		return compact.String(), nil
+	case model.SettingTypeBool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s must be true or false", ErrInvalidSetting, def.Key)
+		}
+		return strconv.FormatBool(v), nil
+	case model.SettingTypeInt:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s must be an integer", ErrInvalidSetting, def.Key)
+		}
+		number, value = float64(v), strconv.Itoa(v)
+	case model.SettingTypeFloat:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s must be a number", ErrInvalidSetting, def.Key)
+		}
+		number, value = v, strconv.FormatFloat(v, 'f', -1, 64)
+	case model.SettingTypeDuration:
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s must be a duration such as 30s or 24h", ErrInvalidSetting, def.Key)
+		}
+		// Minimums of durations are in seconds
+		number, value = v.Seconds(), v.String()
+	default:
+		return "", fmt.Errorf("%w: %s has unsupported type %s", ErrInvalidSetting, def.Key, def.Type)
+	}
+
+	if def.Min != nil && number < *def.Min {
+		return "", fmt.Errorf("%w: %s must be at least %v", ErrInvalidSetting, def.Key, *def.Min)
+	}
+	return value, nil
+}
@@ -0,0 +1,633 @@
+// Package service provides SLO evaluation, error budgets and burn-rate alerts
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// SLO settings
+const (
+	sloEvaluationInterval = time.Minute
+	defaultSLOWindow      = 30 * 24 * 3600
+	minSLOWindow          = 3600
+	maxSLOWindow          = 90 * 24 * 3600
+	minSLOAlertWindow     = 60
+	sloAtRiskBudget       = 25 // percent of the error budget left
+	sloHistoryPoints      = 200
+)
+
+var (
+	// ErrSLONotFound is returned when the user has no such SLO
+	ErrSLONotFound = errors.New("slo not found")
+	// ErrInvalidSLO is returned for invalid SLO definitions
+	ErrInvalidSLO = errors.New("invalid slo")
+)
+
+// SLOService evaluates SLOs against their Prometheus data source, tracks their
+// error budgets and fires their burn-rate alerts. Each burn-rate alert is an
+// alert rule the SLO manages, so its alerts go through the alert pipeline:
+// maintenance windows, grouping, events and runbooks.
+type SLOService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	engine *AlertEngine
+}
+
+// NewSLOService creates a new SLO service
+func NewSLOService(db *gorm.DB, logger *zap.Logger, engine *AlertEngine) *SLOService {
+	return &SLOService{db: db, logger: logger, engine: engine}
+}
+
+// ============== Definitions ==============
+
+// List lists the user's SLOs
+func (s *SLOService) List(userID uuid.UUID) ([]model.SLOResponse, error) {
+	var slos []model.SLO
+	if err := s.db.Where("user_id = ?", userID).Order("name").Find(&slos).Error; err != nil {
+		return nil, err
+	}
+	resp := make([]model.SLOResponse, 0, len(slos))
+	for i := range slos {
+		resp = append(resp, slos[i].Response())
+	}
+	return resp, nil
+}
+
+// Get gets one of the user's SLOs
+func (s *SLOService) Get(userID, id uuid.UUID) (*model.SLOResponse, error) {
+	slo, err := s.find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	resp := slo.Response()
+	return &resp, nil
+}
+
+func (s *SLOService) find(userID, id uuid.UUID) (*model.SLO, error) {
+	var slo model.SLO
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&slo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSLONotFound
+		}
+		return nil, err
+	}
+	return &slo, nil
+}
+
+// Create defines an SLO and the alert rules of its burn-rate alerts
+func (s *SLOService) Create(userID uuid.UUID, req *model.CreateSLORequest) (*model.SLOResponse, error) {
+	slo := &model.SLO{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Name:         strings.TrimSpace(req.Name),
+		Description:  req.Description,
+		DataSourceID: req.DataSourceID,
+		GoodQuery:    strings.TrimSpace(req.GoodQuery),
+		TotalQuery:   strings.TrimSpace(req.TotalQuery),
+		Objective:    req.Objective,
+		Window:       req.Window,
+		Enabled:      req.Enabled == nil || *req.Enabled,
+		Status:       model.SLOStatusUnknown,
+	}
+	if slo.Window == 0 {
+		slo.Window = defaultSLOWindow
+	}
+	alerts := append([]model.SLOBurnRateAlert(nil), model.DefaultSLOBurnRateAlerts...)
+	if req.BurnRateAlerts != nil {
+		alerts = burnRateAlerts(*req.BurnRateAlerts)
+	}
+	if err := s.validate(slo, alerts); err != nil {
+		return nil, err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.syncRules(tx, slo, nil, alerts); err != nil {
+			return err
+		}
+		return tx.Create(slo).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := slo.Response()
+	return &resp, nil
+}
+
+// Update changes the given fields of one of the user's SLOs. Burn-rate alerts
+// keep their alert rules by position; rules of removed alerts are deleted
+// with their alerts.
+func (s *SLOService) Update(userID, id uuid.UUID, req *model.UpdateSLORequest) (*model.SLOResponse, error) {
+	slo, err := s.find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	old := slo.Response().BurnRateAlerts
+
+	if req.Name != nil {
+		slo.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		slo.Description = *req.Description
+	}
+	if req.DataSourceID != nil {
+		slo.DataSourceID = *req.DataSourceID
+	}
+	if req.GoodQuery != nil {
+		slo.GoodQuery = strings.TrimSpace(*req.GoodQuery)
+	}
+	if req.TotalQuery != nil {
+		slo.TotalQuery = strings.TrimSpace(*req.TotalQuery)
+	}
+	if req.Objective != nil {
+		slo.Objective = *req.Objective
+	}
+	if req.Window != nil {
+		slo.Window = *req.Window
+	}
+	if req.Enabled != nil {
+		slo.Enabled = *req.Enabled
+	}
+	alerts := old
+	if req.BurnRateAlerts != nil {
+		alerts = burnRateAlerts(*req.BurnRateAlerts)
+	}
+	if err := s.validate(slo, alerts); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.syncRules(tx, slo, old, alerts); err != nil {
+			return err
+		}
+		return tx.Model(slo).Select("name", "description", "data_source_id", "good_query", "total_query",
+			"objective", "window_seconds", "enabled", "burn_rate_alerts").Updates(slo).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !slo.Enabled {
+		s.resolveAlerts(alerts)
+	}
+	resp := slo.Response()
+	return &resp, nil
+}
+
+// Delete removes one of the user's SLOs with its alert rules and their alerts
+func (s *SLOService) Delete(userID, id uuid.UUID) error {
+	slo, err := s.find(userID, id)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteSLORules(tx, slo.Response().BurnRateAlerts); err != nil {
+			return err
+		}
+		return tx.Delete(slo).Error
+	})
+}
+
+// burnRateAlerts converts requested burn-rate alerts
+func burnRateAlerts(reqs []model.SLOBurnRateAlertRequest) []model.SLOBurnRateAlert {
+	alerts := make([]model.SLOBurnRateAlert, 0, len(reqs))
+	for _, r := range reqs {
+		alerts = append(alerts, model.SLOBurnRateAlert{Severity: r.Severity, Factor: r.Factor, LongWindow: r.LongWindow, ShortWindow: r.ShortWindow})
+	}
+	return alerts
+}
+
+// validate checks an SLO and its burn-rate alerts
+func (s *SLOService) validate(slo *model.SLO, alerts []model.SLOBurnRateAlert) error {
+	if slo.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSLO)
+	}
+	for _, q := range []string{slo.GoodQuery, slo.TotalQuery} {
+		if !strings.Contains(q, model.SLOWindowPlaceholder) {
+			return fmt.Errorf("%w: goodQuery and totalQuery must use %s as their range, e.g. rate(http_requests_total[%s])",
+				ErrInvalidSLO, model.SLOWindowPlaceholder, model.SLOWindowPlaceholder)
+		}
+	}
+	if slo.Objective <= 0 || slo.Objective >= 100 {
+		return fmt.Errorf("%w: objective must be a percentage between 0 and 100", ErrInvalidSLO)
+	}
+	if slo.Window < minSLOWindow || slo.Window > maxSLOWindow {
+		return fmt.Errorf("%w: window must be between %d and %d seconds", ErrInvalidSLO, minSLOWindow, maxSLOWindow)
+	}
+	var found int64
+	if err := s.db.Model(&model.PrometheusDataSource{}).Where("id = ? AND user_id = ?", slo.DataSourceID, slo.UserID).Count(&found).Error; err != nil {
+		return err
+	}
+	if found == 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidSLO, ErrPrometheusDataSourceNotFound)
+	}
+
+	for _, a := range alerts {
+		switch a.Severity {
+		case model.AlertSeverityInfo, model.AlertSeverityWarning, model.AlertSeverityCritical:
+		default:
+			return fmt.Errorf("%w: burn-rate alert severity must be info, warning or critical", ErrInvalidSLO)
+		}
+		if a.Factor <= 0 {
+			return fmt.Errorf("%w: burn-rate alert factor must be positive", ErrInvalidSLO)
+		}
+		if a.ShortWindow < minSLOAlertWindow || a.ShortWindow >= a.LongWindow || a.LongWindow > slo.Window {
+			return fmt.Errorf("%w: burn-rate alert windows must be at least %d seconds, with the short window shorter than the long and the long no longer than the SLO window",
+				ErrInvalidSLO, minSLOAlertWindow)
+		}
+	}
+	return nil
+}
+
+// syncRules creates or updates the alert rule of each burn-rate alert, reusing
+// the rules of the old alerts in order, deletes the rules left over and stores
+// the alerts on the SLO
+func (s *SLOService) syncRules(tx *gorm.DB, slo *model.SLO, old, alerts []model.SLOBurnRateAlert) error {
+	for i := range alerts {
+		a := &alerts[i]
+		rule := model.AlertRule{
+			UserID:      slo.UserID,
+			Name:        fmt.Sprintf("%s: burn rate over %gx (%s/%s)", slo.Name, a.Factor, promWindow(a.LongWindow), promWindow(a.ShortWindow)),
+			Description: fmt.Sprintf("Error budget of SLO %s burning over %gx the sustainable rate. Managed by the SLO.", slo.Name, a.Factor),
+			Enabled:     slo.Enabled,
+			TargetType:  "slo",
+			TargetID:    slo.ID.String(),
+			MetricType:  model.AlertMetricSLOBurnRate,
+			Operator:    ">",
+			Threshold:   a.Factor,
+			Duration:    int32(a.LongWindow),
+			Severity:    a.Severity,
+		}
+		if i < len(old) {
+			a.RuleID = old[i].RuleID
+			err := tx.Model(&model.AlertRule{}).Where("id = ?", a.RuleID).Updates(map[string]interface{}{
+				"name":        rule.Name,
+				"description": rule.Description,
+				"enabled":     rule.Enabled,
+				"threshold":   rule.Threshold,
+				"duration":    rule.Duration,
+				"severity":    rule.Severity,
+			}).Error
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		rule.ID = uuid.New()
+		if err := tx.Create(&rule).Error; err != nil {
+			return err
+		}
+		a.RuleID = rule.ID
+	}
+	if len(old) > len(alerts) {
+		if err := deleteSLORules(tx, old[len(alerts):]); err != nil {
+			return err
+		}
+	}
+
+	data, _ := json.Marshal(alerts)
+	slo.BurnRateAlerts = string(data)
+	return nil
+}
+
+// deleteSLORules deletes the alert rules of burn-rate alerts with their alerts
+func deleteSLORules(tx *gorm.DB, alerts []model.SLOBurnRateAlert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(alerts))
+	for _, a := range alerts {
+		ids = append(ids, a.RuleID)
+	}
+	if err := tx.Where("rule_id IN ?", ids).Delete(&model.Alert{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("id IN ?", ids).Delete(&model.AlertRule{}).Error
+}
+
+// resolveAlerts resolves the open alerts of burn-rate alerts, as a disabled SLO
+// no longer evaluates them
+func (s *SLOService) resolveAlerts(alerts []model.SLOBurnRateAlert) {
+	for _, a := range alerts {
+		var open []model.Alert
+		if err := s.db.Where("rule_id = ? AND status IN ?", a.RuleID, []model.AlertStatus{model.AlertStatusFiring, model.AlertStatusSilenced}).Find(&open).Error; err != nil {
+			s.logger.Error("failed to load slo alerts", zap.String("ruleId", a.RuleID.String()), zap.Error(err))
+			continue
+		}
+		for i := range open {
+			if err := s.engine.resolveAlert(&open[i]); err != nil {
+				s.logger.Error("failed to resolve slo alert", zap.String("alertId", open[i].ID.String()), zap.Error(err))
+			}
+		}
+	}
+}
+
+// ============== Evaluation ==============
+
+// Run evaluates the enabled SLOs every minute until ctx is cancelled
+func (s *SLOService) Run(ctx context.Context) {
+	ticker := time.NewTicker(sloEvaluationInterval)
+	defer ticker.Stop()
+
+	for {
+		s.evaluateDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// evaluateDue evaluates every enabled SLO not evaluated in the last interval.
+// An SLO is claimed by moving its last evaluation, so each is evaluated once
+// per interval even with several gateway replicas.
+func (s *SLOService) evaluateDue(ctx context.Context) {
+	now := time.Now()
+	cutoff := now.Add(-sloEvaluationInterval / 2)
+	var due []model.SLO
+	if err := s.db.Where("enabled = ? AND (last_evaluated_at IS NULL OR last_evaluated_at < ?)", true, cutoff).Find(&due).Error; err != nil {
+		s.logger.Error("failed to load slos", zap.Error(err))
+		return
+	}
+
+	for i := range due {
+		slo := &due[i]
+		claim := s.db.Model(&model.SLO{}).
+			Where("id = ? AND (last_evaluated_at IS NULL OR last_evaluated_at < ?)", slo.ID, cutoff).
+			Update("last_evaluated_at", now)
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+		if _, err := s.evaluate(ctx, slo); err != nil {
+			s.logger.Error("failed to evaluate slo", zap.String("sloId", slo.ID.String()), zap.Error(err))
+		}
+	}
+}
+
+// Evaluate evaluates one of the user's SLOs now
+func (s *SLOService) Evaluate(ctx context.Context, userID, id uuid.UUID) (*model.SLOResponse, error) {
+	slo, err := s.find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.evaluate(ctx, slo)
+}
+
+// evaluate computes the SLI and error budget of an SLO over its window and
+// the burn rates of its alerts, and evaluates the alert rule of each with the
+// lower of its long and short window burn rates. A window without events burns
+// nothing. When a query fails the SLO is unknown and its alerts are left as
+// they are. Only database errors are returned; query errors are recorded as
+// the SLO's last error.
+func (s *SLOService) evaluate(ctx context.Context, slo *model.SLO) (*model.SLOResponse, error) {
+	now := time.Now()
+	resp := slo.Response()
+	alerts := resp.BurnRateAlerts
+
+	ratios := map[int]*float64{}
+	var queryErr error
+	ratio := func(client PrometheusQuerier, window int) *float64 {
+		if sli, ok := ratios[window]; ok {
+			return sli
+		}
+		sli, err := s.ratio(ctx, client, slo, window, now)
+		if err != nil && queryErr == nil {
+			queryErr = err
+		}
+		ratios[window] = sli
+		return sli
+	}
+
+	client, err := s.client(slo)
+	var sli *float64
+	if err != nil {
+		queryErr = err
+	} else {
+		sli = ratio(client, slo.Window)
+		for i := range alerts {
+			a := &alerts[i]
+			a.LongBurnRate = burnRate(ratio(client, a.LongWindow), slo.Objective)
+			a.ShortBurnRate = burnRate(ratio(client, a.ShortWindow), slo.Objective)
+		}
+	}
+
+	updates := map[string]interface{}{
+		"status":                 model.SLOStatusUnknown,
+		"sli":                    nil,
+		"error_budget_remaining": nil,
+		"last_evaluated_at":      now,
+		"last_error":             "",
+	}
+	if queryErr != nil {
+		updates["last_error"] = queryErr.Error()
+	} else {
+		if sli != nil {
+			remaining := 100 - (100-*sli)/(100-slo.Objective)*100
+			updates["sli"] = *sli
+			updates["error_budget_remaining"] = remaining
+			switch {
+			case remaining <= 0:
+				updates["status"] = model.SLOStatusBreached
+			case remaining < sloAtRiskBudget:
+				updates["status"] = model.SLOStatusAtRisk
+			default:
+				updates["status"] = model.SLOStatusMet
+			}
+		}
+		s.evaluateAlerts(alerts, now)
+		data, _ := json.Marshal(alerts)
+		updates["burn_rate_alerts"] = string(data)
+	}
+
+	if err := s.db.Model(slo).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return s.Get(slo.UserID, slo.ID)
+}
+
+// evaluateAlerts evaluates the alert rule of each burn-rate alert that is
+// enabled and not silenced
+func (s *SLOService) evaluateAlerts(alerts []model.SLOBurnRateAlert, now time.Time) {
+	for _, a := range alerts {
+		var rule model.AlertRule
+		if err := s.db.Where("id = ?", a.RuleID).First(&rule).Error; err != nil {
+			s.logger.Error("failed to load slo alert rule", zap.String("ruleId", a.RuleID.String()), zap.Error(err))
+			continue
+		}
+		if !rule.Enabled || (rule.SilencedUntil != nil && rule.SilencedUntil.After(now)) {
+			continue
+		}
+		value := 0.0
+		if a.LongBurnRate != nil && a.ShortBurnRate != nil {
+			value = math.Min(*a.LongBurnRate, *a.ShortBurnRate)
+		}
+		if err := s.engine.EvaluateValue(&rule, value); err != nil {
+			s.logger.Error("failed to evaluate slo alert rule", zap.String("ruleId", rule.ID.String()), zap.Error(err))
+		}
+	}
+}
+
+// client returns a client of the SLO's data source
+func (s *SLOService) client(slo *model.SLO) (PrometheusQuerier, error) {
+	var ds model.PrometheusDataSource
+	if err := s.db.Where("id = ? AND user_id = ?", slo.DataSourceID, slo.UserID).First(&ds).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPrometheusDataSourceNotFound
+		}
+		return nil, err
+	}
+	return NewDataSourceQuerier(s.db, &ds)
+}
+
+// ratio returns the SLI in percent over the window ending at t, or nil when
+// there were no events
+func (s *SLOService) ratio(ctx context.Context, client PrometheusQuerier, slo *model.SLO, window int, t time.Time) (*float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	good, err := s.instant(ctx, client, sloQuery(slo.GoodQuery, window), t)
+	if err != nil {
+		return nil, fmt.Errorf("good query: %w", err)
+	}
+	total, err := s.instant(ctx, client, sloQuery(slo.TotalQuery, window), t)
+	if err != nil {
+		return nil, fmt.Errorf("total query: %w", err)
+	}
+	if total <= 0 {
+		return nil, nil
+	}
+	sli := math.Min(good/total, 1) * 100
+	return &sli, nil
+}
+
+// instant sums the values of the series a query returns at t
+func (s *SLOService) instant(ctx context.Context, client PrometheusQuerier, query string, t time.Time) (float64, error) {
+	series, _, err := client.Query(ctx, query, t)
+	if err != nil {
+		return 0, err
+	}
+	sum := 0.0
+	for _, ser := range series {
+		if ser.Value != nil {
+			sum += seriesValue(ser.Value.Value)
+		}
+	}
+	return sum, nil
+}
+
+// History returns the SLI and remaining error budget over the SLO window at
+// points between start and end, by default the last SLO window
+func (s *SLOService) History(ctx context.Context, userID, id uuid.UUID, start, end time.Time) (*model.SLOHistory, error) {
+	slo, err := s.find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if start.IsZero() {
+		start = end.Add(-time.Duration(slo.Window) * time.Second)
+	}
+	if !start.Before(end) {
+		return nil, fmt.Errorf("%w: start must be before end", ErrInvalidSLO)
+	}
+	step := (end.Sub(start) / sloHistoryPoints).Truncate(time.Second)
+	if step < time.Minute {
+		step = time.Minute
+	}
+
+	client, err := s.client(slo)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	good, err := s.rangeSums(ctx, client, sloQuery(slo.GoodQuery, slo.Window), start, end, step)
+	if err != nil {
+		return nil, fmt.Errorf("%w: good query: %v", ErrPrometheusQueryFailed, err)
+	}
+	total, err := s.rangeSums(ctx, client, sloQuery(slo.TotalQuery, slo.Window), start, end, step)
+	if err != nil {
+		return nil, fmt.Errorf("%w: total query: %v", ErrPrometheusQueryFailed, err)
+	}
+
+	history := &model.SLOHistory{SLOID: slo.ID, Start: start, End: end, Step: int(step / time.Second), Points: []model.SLOHistoryPoint{}}
+	for ts, t := range total {
+		if t <= 0 {
+			continue
+		}
+		sli := math.Min(good[ts]/t, 1) * 100
+		history.Points = append(history.Points, model.SLOHistoryPoint{
+			Timestamp:            time.Unix(0, int64(ts*float64(time.Second))).UTC(),
+			SLI:                  sli,
+			ErrorBudgetRemaining: 100 - (100-sli)/(100-slo.Objective)*100,
+		})
+	}
+	sort.Slice(history.Points, func(i, j int) bool { return history.Points[i].Timestamp.Before(history.Points[j].Timestamp) })
+	return history, nil
+}
+
+// rangeSums sums the values of the series a range query returns by timestamp
+func (s *SLOService) rangeSums(ctx context.Context, client PrometheusQuerier, query string, start, end time.Time, step time.Duration) (map[float64]float64, error) {
+	series, _, err := client.QueryRange(ctx, query, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	sums := map[float64]float64{}
+	for _, ser := range series {
+		for _, v := range ser.Values {
+			sums[v.Timestamp] += seriesValue(v.Value)
+		}
+	}
+	return sums, nil
+}
+
+// burnRate is how many times faster than sustainable an SLI spends the error
+// budget, or nil without an SLI
+func burnRate(sli *float64, objective float64) *float64 {
+	if sli == nil {
+		return nil
+	}
+	rate := (100 - *sli) / (100 - objective)
+	return &rate
+}
+
+// sloQuery substitutes the window of an SLI query
+func sloQuery(query string, window int) string {
+	return strings.ReplaceAll(query, model.SLOWindowPlaceholder, promWindow(window))
+}
+
+// promWindow formats seconds as a PromQL range in the largest whole unit, e.g. 30d or 5m
+func promWindow(seconds int) string {
+	switch {
+	case seconds%(24*3600) == 0:
+		return fmt.Sprintf("%dd", seconds/(24*3600))
+	case seconds%3600 == 0:
+		return fmt.Sprintf("%dh", seconds/3600)
+	case seconds%60 == 0:
+		return fmt.Sprintf("%dm", seconds/60)
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+// seriesValue parses a sample value, counting NaN and infinities as 0
+func seriesValue(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,418 @@
+// Package service provides OIDC and LDAP single sign-on configured through settings
+package service
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	ldapauth "github.com/wangjialin/myops/pkg/auth/ldap"
+	"github.com/wangjialin/myops/pkg/auth/oidc"
+	apperrors "github.com/wangjialin/myops/pkg/errors"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// OIDCLoginState is what a login must present again at the callback. It is kept by
+// the browser between the redirect to the provider and the callback.
+type OIDCLoginState struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// SSOService logs users in through an OIDC provider or LDAP, provisions their local
+// accounts on first login and keeps their roles in step with their groups. All of
+// it is configured through settings, so providers can be changed without a restart.
+type SSOService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	settings *SettingsService
+
+	mu          sync.Mutex
+	provider    *oidc.Provider
+	providerKey string
+}
+
+// NewSSOService creates a new SSO service
+func NewSSOService(db *gorm.DB, logger *zap.Logger, settings *SettingsService) *SSOService {
+	return &SSOService{
+		db:       db,
+		logger:   logger,
+		settings: settings,
+	}
+}
+
+// ============== OIDC ==============
+
+// OIDCEnabled reports whether OIDC login is enabled and configured
+func (s *SSOService) OIDCEnabled() bool {
+	if s == nil || !s.settings.Bool(model.SettingOIDCEnabled) {
+		return false
+	}
+	return s.settings.String(model.SettingOIDCIssuerURL) != "" &&
+		s.settings.String(model.SettingOIDCClientID) != "" &&
+		s.settings.String(model.SettingOIDCRedirectURL) != ""
+}
+
+// BeginOIDCLogin returns the provider URL to send the browser to, and the state the
+// callback must present
+func (s *SSOService) BeginOIDCLogin(ctx context.Context) (string, *OIDCLoginState, error) {
+	provider, err := s.oidcProvider()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var state OIDCLoginState
+	for _, v := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		if *v, err = oidc.RandomString(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		return "", nil, apperrors.Wrap("OIDC_UNAVAILABLE", "Identity provider is unavailable", err)
+	}
+	return authURL, &state, nil
+}
+
+// CompleteOIDCLogin exchanges the authorization code, verifies the ID token and
+// returns the local user, creating it on first login. The caller must already have
+// checked that the callback's state matches state.State.
+func (s *SSOService) CompleteOIDCLogin(ctx context.Context, code string, state *OIDCLoginState) (*model.User, string, error) {
+	provider, err := s.oidcProvider()
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := provider.Exchange(ctx, code, state.Verifier)
+	if err != nil {
+		return nil, "", apperrors.Wrap("OIDC_AUTH_FAILED", "OIDC authentication failed: "+err.Error(), err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, state.Nonce)
+	if err != nil {
+		return nil, "", apperrors.Wrap("OIDC_AUTH_FAILED", "OIDC authentication failed: "+err.Error(), err)
+	}
+
+	issuer, subject := claims.String("iss"), claims.String("sub")
+	if subject == "" {
+		return nil, "", apperrors.NewError("OIDC_AUTH_FAILED", "OIDC authentication failed: id_token has no subject")
+	}
+
+	username := claims.String(s.settings.String(model.SettingOIDCUsernameClaim))
+	if username == "" {
+		username = claims.String("email")
+	}
+	if username == "" {
+		username = subject
+	}
+	email := claims.String("email")
+	if email == "" {
+		email = username + "@oidc.local"
+	}
+	displayName := claims.String("name")
+	if displayName == "" {
+		displayName = username
+	}
+
+	user, err := s.linkOIDCUser(issuer, subject, username, email, displayName)
+	if err != nil {
+		return nil, "", err
+	}
+	if !user.IsActive {
+		return nil, "", apperrors.ErrUserDisabled
+	}
+
+	groups := claims.Strings(s.settings.String(model.SettingOIDCGroupsClaim))
+	if err := s.SyncGroupRoles(user.ID, groups); err != nil {
+		return nil, "", err
+	}
+
+	s.logger.Info("OIDC login",
+		zap.String("userId", user.ID.String()),
+		zap.String("username", user.Username),
+		zap.Int("groups", len(groups)),
+	)
+	return user, displayName, nil
+}
+
+// linkOIDCUser returns the user linked to the identity, creating both on first
+// login. Existing accounts are only linked by username or email if directory sync
+// provisioned them for the provider; linking others would let whoever controls a
+// name at the provider take over the local account.
+func (s *SSOService) linkOIDCUser(issuer, subject, username, email, displayName string) (*model.User, error) {
+	now := time.Now()
+	var user model.User
+
+	var identity model.UserIdentity
+	err := s.db.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error
+	if err == nil {
+		if err := s.db.Where("id = ?", identity.UserID).First(&user).Error; err != nil {
+			return nil, err
+		}
+		updates := map[string]interface{}{"last_login_at": now}
+		if user.Email != email {
+			updates["email"] = email
+		}
+		if user.DisplayName != displayName {
+			updates["display_name"] = displayName
+		}
+		if err := s.db.Model(&user).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+		s.db.Model(&identity).Update("last_login_at", now)
+		return &user, nil
+	}
+	if !stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var taken []model.User
+	if err := s.db.Where("username = ? OR email = ?", username, email).Find(&taken).Error; err != nil {
+		return nil, err
+	}
+	if len(taken) == 1 && s.provisionedUnlinked(&taken[0]) {
+		// Provisioned ahead of first login by directory sync
+		user = taken[0]
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Updates(map[string]interface{}{"last_login_at": now, "display_name": displayName}).Error; err != nil {
+				return err
+			}
+			return tx.Create(&model.UserIdentity{
+				UserID:      user.ID,
+				Provider:    model.IdentityProviderOIDC,
+				Issuer:      issuer,
+				Subject:     subject,
+				LastLoginAt: &now,
+			}).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.logger.Info("linked provisioned user to OIDC identity", zap.String("userId", user.ID.String()), zap.String("username", username))
+		return &user, nil
+	}
+	if len(taken) > 0 {
+		return nil, apperrors.NewError("SSO_ACCOUNT_CONFLICT",
+			"An account named "+username+" or with email "+email+" already exists and is not linked to this identity provider")
+	}
+
+	user = model.User{
+		ID:          uuid.New(),
+		Username:    username,
+		Email:       email,
+		UserType:    model.UserTypeOIDC,
+		DisplayName: displayName,
+		IsActive:    true,
+		LastLoginAt: &now,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.UserIdentity{
+			UserID:      user.ID,
+			Provider:    model.IdentityProviderOIDC,
+			Issuer:      issuer,
+			Subject:     subject,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("provisioned OIDC user", zap.String("userId", user.ID.String()), zap.String("username", username))
+	return &user, nil
+}
+
+// provisionedUnlinked reports whether a user was provisioned for the identity
+// provider by directory sync and has not logged in through it yet
+func (s *SSOService) provisionedUnlinked(user *model.User) bool {
+	if user.UserType != model.UserTypeOIDC {
+		return false
+	}
+	var linked int64
+	s.db.Model(&model.UserIdentity{}).
+		Where("user_id = ? AND provider = ?", user.ID, model.IdentityProviderOIDC).
+		Count(&linked)
+	return linked == 0
+}
+
+// oidcProvider returns the provider for the current settings, replacing the cached
+// one when they change
+func (s *SSOService) oidcProvider() (*oidc.Provider, error) {
+	if !s.OIDCEnabled() {
+		return nil, apperrors.NewError("OIDC_NOT_CONFIGURED", "OIDC authentication is not configured")
+	}
+
+	config := oidc.Config{
+		IssuerURL:    s.settings.String(model.SettingOIDCIssuerURL),
+		ClientID:     s.settings.String(model.SettingOIDCClientID),
+		ClientSecret: s.settings.String(model.SettingOIDCClientSecret),
+		RedirectURL:  s.settings.String(model.SettingOIDCRedirectURL),
+		Scopes:       strings.Fields(s.settings.String(model.SettingOIDCScopes)),
+	}
+	key := strings.Join([]string{config.IssuerURL, config.ClientID, config.ClientSecret, config.RedirectURL,
+		strings.Join(config.Scopes, " ")}, "\n")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.provider == nil || s.providerKey != key {
+		s.provider = oidc.NewProvider(config)
+		s.providerKey = key
+	}
+	return s.provider, nil
+}
+
+// ============== LDAP ==============
+
+// LDAPClient returns a client for the current LDAP settings, or nil if LDAP login
+// is disabled
+func (s *SSOService) LDAPClient() *ldapauth.Client {
+	if s == nil || !s.settings.Bool(model.SettingLDAPEnabled) {
+		return nil
+	}
+	url := s.settings.String(model.SettingLDAPURL)
+	if url == "" {
+		return nil
+	}
+
+	attributes := []string{"uid", "cn", "mail", "displayName"}
+	if group := s.LDAPGroupAttribute(); group != "" {
+		attributes = append(attributes, group)
+	}
+	return ldapauth.NewClient(ldapauth.Config{
+		URL:            url,
+		BindDN:         s.settings.String(model.SettingLDAPBindDN),
+		BindPassword:   s.settings.String(model.SettingLDAPBindPassword),
+		BaseDN:         s.settings.String(model.SettingLDAPBaseDN),
+		SearchFilter:   s.settings.String(model.SettingLDAPUserFilter),
+		UserAttributes: attributes,
+		UseTLS:         strings.HasPrefix(url, "ldaps://"),
+		Timeout:        10 * time.Second,
+	})
+}
+
+// LDAPGroupAttribute returns the LDAP attribute listing a user's groups
+func (s *SSOService) LDAPGroupAttribute() string {
+	return s.settings.String(model.SettingLDAPGroupAttribute)
+}
+
+// ============== Group Role Mapping ==============
+
+// SyncGroupRoles gives an SSO user the default role and the roles their groups map
+// to, and takes away mapped roles their groups no longer grant. Roles that appear
+// in no mapping are left alone, so roles assigned by hand survive logins.
+func (s *SSOService) SyncGroupRoles(userID uuid.UUID, groups []string) error {
+	grant, revoke, err := s.PlanGroupRoles(userID, groups)
+	if err != nil || len(grant)+len(revoke) == 0 {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, role := range grant {
+			if err := tx.Create(&model.UserRole{UserID: userID, RoleID: role.ID}).Error; err != nil {
+				return err
+			}
+		}
+		for _, role := range revoke {
+			if err := tx.Where("user_id = ? AND role_id = ? AND resource_id IS NULL", userID, role.ID).
+				Delete(&model.UserRole{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PlanGroupRoles returns the roles SyncGroupRoles would grant and revoke, without
+// changing anything. A zero userID plans for a user that does not exist yet.
+func (s *SSOService) PlanGroupRoles(userID uuid.UUID, groups []string) (grant, revoke []model.Role, err error) {
+	mapping := make(map[string][]string)
+	if raw := s.settings.String(model.SettingSSOGroupRoleMapping); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			s.logger.Error("invalid SSO group role mapping", zap.Error(err))
+		}
+	}
+	defaultRole := s.settings.String(model.SettingSSODefaultRole)
+
+	managed := make(map[string]bool)
+	granted := make(map[string]bool)
+	for _, roles := range mapping {
+		for _, role := range roles {
+			managed[role] = true
+		}
+	}
+	if defaultRole != "" {
+		managed[defaultRole] = true
+		granted[defaultRole] = true
+	}
+	for _, group := range groups {
+		for _, name := range groupNames(group) {
+			for _, role := range mapping[name] {
+				granted[role] = true
+			}
+		}
+	}
+	if len(managed) == 0 {
+		return nil, nil, nil
+	}
+
+	names := make([]string, 0, len(managed))
+	for name := range managed {
+		names = append(names, name)
+	}
+	var roles []model.Role
+	if err := s.db.Where("name IN ?", names).Order("name").Find(&roles).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, role := range roles {
+		delete(managed, role.Name)
+	}
+	for name := range managed {
+		s.logger.Warn("SSO group role mapping names an unknown role", zap.String("role", name))
+	}
+
+	var assigned []uuid.UUID
+	if userID != uuid.Nil {
+		if err := s.db.Model(&model.UserRole{}).
+			Where("user_id = ? AND resource_id IS NULL", userID).
+			Pluck("role_id", &assigned).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	has := make(map[uuid.UUID]bool, len(assigned))
+	for _, id := range assigned {
+		has[id] = true
+	}
+
+	for _, role := range roles {
+		switch {
+		case granted[role.Name] && !has[role.ID]:
+			grant = append(grant, role)
+		case !granted[role.Name] && has[role.ID]:
+			revoke = append(revoke, role)
+		}
+	}
+	return grant, revoke, nil
+}
+
+// groupNames returns the names a group can be mapped by: the group itself and, for
+// LDAP DNs such as cn=ops,ou=groups,dc=example,dc=com, its common name
+func groupNames(group string) []string {
+	names := []string{group}
+	first := strings.SplitN(group, ",", 2)[0]
+	if kv := strings.SplitN(first, "=", 2); len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "cn") {
+		if cn := strings.TrimSpace(kv[1]); cn != group {
+			names = append(names, cn)
+		}
+	}
+	return names
+}
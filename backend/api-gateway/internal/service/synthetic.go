@@ -0,0 +1,701 @@
+// Package service provides synthetic checks: scheduled black-box probes of
+// endpoints from the gateway and from host agents
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Synthetic check settings
+const (
+	syntheticTickInterval    = 5 * time.Second
+	syntheticPruneInterval   = time.Hour
+	syntheticConcurrency     = 16 // Checks run at once by one gateway
+	defaultSyntheticInterval = 60
+	minSyntheticInterval     = 10
+	maxSyntheticInterval     = 24 * 3600
+	defaultSyntheticTimeout  = 10
+	maxSyntheticTimeout      = 60
+	maxSyntheticLocations    = 20
+	// syntheticAgentGrace is how much longer than the probe timeout an agent
+	// gets to pick up and report a probe
+	syntheticAgentGrace = 15 * time.Second
+)
+
+var (
+	// ErrSyntheticCheckNotFound is returned when the user has no such check
+	ErrSyntheticCheckNotFound = errors.New("synthetic check not found")
+	// ErrInvalidSyntheticCheck is returned for invalid check definitions
+	ErrInvalidSyntheticCheck = errors.New("invalid synthetic check")
+)
+
+// SyntheticService runs synthetic checks on their intervals, from the gateway
+// and from the agents of their location hosts, records the results and keeps
+// uptime statistics. Each check has an alert rule it manages, evaluated with
+// the number of failing locations, so failures go through the alert pipeline.
+type SyntheticService struct {
+	db       *gorm.DB
+	logger   *zap.Logger
+	settings *SettingsService
+	commands *AgentCommandService
+	engine   *AlertEngine
+	slots    chan struct{}
+}
+
+// NewSyntheticService creates a new synthetic check service
+func NewSyntheticService(db *gorm.DB, logger *zap.Logger, settings *SettingsService, commands *AgentCommandService, engine *AlertEngine) *SyntheticService {
+	return &SyntheticService{
+		db:       db,
+		logger:   logger,
+		settings: settings,
+		commands: commands,
+		engine:   engine,
+		slots:    make(chan struct{}, syntheticConcurrency),
+	}
+}
+
+// ============== Checks ==============
+
+// List lists the user's checks
+func (s *SyntheticService) List(userID uuid.UUID) ([]model.SyntheticCheckResponse, error) {
+	var checks []model.SyntheticCheck
+	if err := s.db.Where("user_id = ?", userID).Order("name").Find(&checks).Error; err != nil {
+		return nil, err
+	}
+	resp := make([]model.SyntheticCheckResponse, 0, len(checks))
+	for i := range checks {
+		resp = append(resp, checks[i].Response())
+	}
+	return resp, nil
+}
+
+// Get gets one of the user's checks
+func (s *SyntheticService) Get(userID, id uuid.UUID) (*model.SyntheticCheckResponse, error) {
+	check, err := s.find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	resp := check.Response()
+	return &resp, nil
+}
+
+func (s *SyntheticService) find(userID, id uuid.UUID) (*model.SyntheticCheck, error) {
+	var check model.SyntheticCheck
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&check).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSyntheticCheckNotFound
+		}
+		return nil, err
+	}
+	return &check, nil
+}
+
+// Create adds a check and its alert rule. The first run is due at once.
+func (s *SyntheticService) Create(userID uuid.UUID, req *model.CreateSyntheticCheckRequest) (*model.SyntheticCheckResponse, error) {
+	check := &model.SyntheticCheck{
+		ID:               uuid.New(),
+		UserID:           userID,
+		Name:             strings.TrimSpace(req.Name),
+		Type:             req.Type,
+		Target:           strings.TrimSpace(req.Target),
+		Method:           strings.ToUpper(req.Method),
+		Interval:         req.Interval,
+		Timeout:          req.Timeout,
+		ExpectedStatus:   req.ExpectedStatus,
+		BodyRegex:        req.BodyRegex,
+		MaxLatency:       req.MaxLatency,
+		FailureThreshold: req.FailureThreshold,
+		Severity:         req.Severity,
+		Enabled:          req.Enabled == nil || *req.Enabled,
+		Status:           model.SyntheticCheckUnknown,
+		AlertRuleID:      uuid.New(),
+	}
+	if check.Interval == 0 {
+		check.Interval = defaultSyntheticInterval
+	}
+	if check.Timeout == 0 {
+		check.Timeout = defaultSyntheticTimeout
+	}
+	if check.FailureThreshold == 0 {
+		check.FailureThreshold = 1
+	}
+	if check.Severity == "" {
+		check.Severity = model.AlertSeverityCritical
+	}
+	locations := req.Locations
+	if len(locations) == 0 {
+		locations = []string{model.SyntheticLocationGateway}
+	}
+	if err := s.setLocations(check, locations); err != nil {
+		return nil, err
+	}
+	if err := validateSyntheticCheck(check, len(locations)); err != nil {
+		return nil, err
+	}
+	s.plan(check, time.Now())
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		rule := syntheticAlertRule(check)
+		if err := tx.Create(&rule).Error; err != nil {
+			return err
+		}
+		return tx.Create(check).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := check.Response()
+	return &resp, nil
+}
+
+// Update changes the given fields of one of the user's checks and its alert rule
+func (s *SyntheticService) Update(userID, id uuid.UUID, req *model.UpdateSyntheticCheckRequest) (*model.SyntheticCheckResponse, error) {
+	check, err := s.find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	wasEnabled := check.Enabled
+
+	if req.Name != nil {
+		check.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Target != nil {
+		check.Target = strings.TrimSpace(*req.Target)
+	}
+	if req.Method != nil {
+		check.Method = strings.ToUpper(*req.Method)
+	}
+	if req.Interval != nil {
+		check.Interval = *req.Interval
+	}
+	if req.Timeout != nil {
+		check.Timeout = *req.Timeout
+	}
+	if req.ExpectedStatus != nil {
+		check.ExpectedStatus = *req.ExpectedStatus
+	}
+	if req.BodyRegex != nil {
+		check.BodyRegex = *req.BodyRegex
+	}
+	if req.MaxLatency != nil {
+		check.MaxLatency = *req.MaxLatency
+	}
+	if req.FailureThreshold != nil {
+		check.FailureThreshold = *req.FailureThreshold
+	}
+	if req.Severity != nil {
+		check.Severity = *req.Severity
+	}
+	if req.Enabled != nil {
+		check.Enabled = *req.Enabled
+	}
+	if req.Locations != nil {
+		if err := s.setLocations(check, *req.Locations); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateSyntheticCheck(check, len(check.Response().Locations)); err != nil {
+		return nil, err
+	}
+	if check.Enabled != wasEnabled || req.Interval != nil {
+		s.plan(check, time.Now())
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		rule := syntheticAlertRule(check)
+		err := tx.Model(&model.AlertRule{}).Where("id = ?", check.AlertRuleID).Updates(map[string]interface{}{
+			"name":        rule.Name,
+			"description": rule.Description,
+			"enabled":     rule.Enabled,
+			"threshold":   rule.Threshold,
+			"severity":    rule.Severity,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(check).Select("name", "target", "method", "interval", "timeout", "locations", "expected_status",
+			"body_regex", "max_latency", "failure_threshold", "severity", "enabled", "next_run_at").Updates(check).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !check.Enabled && wasEnabled {
+		s.resolveAlerts(check)
+	}
+	resp := check.Response()
+	return &resp, nil
+}
+
+// Delete removes one of the user's checks with its results, alert rule and alerts
+func (s *SyntheticService) Delete(userID, id uuid.UUID) error {
+	check, err := s.find(userID, id)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("check_id = ?", check.ID).Delete(&model.SyntheticResult{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("rule_id = ?", check.AlertRuleID).Delete(&model.Alert{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", check.AlertRuleID).Delete(&model.AlertRule{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(check).Error
+	})
+}
+
+// setLocations checks the locations are the gateway or hosts and stores them as JSON
+func (s *SyntheticService) setLocations(check *model.SyntheticCheck, locations []string) error {
+	if len(locations) == 0 {
+		return fmt.Errorf("%w: at least one location is required", ErrInvalidSyntheticCheck)
+	}
+	if len(locations) > maxSyntheticLocations {
+		return fmt.Errorf("%w: at most %d locations", ErrInvalidSyntheticCheck, maxSyntheticLocations)
+	}
+	seen := map[string]bool{}
+	var hostIDs []uuid.UUID
+	for _, location := range locations {
+		if seen[location] {
+			return fmt.Errorf("%w: duplicate location %s", ErrInvalidSyntheticCheck, location)
+		}
+		seen[location] = true
+		if location == model.SyntheticLocationGateway {
+			continue
+		}
+		id, err := uuid.Parse(location)
+		if err != nil {
+			return fmt.Errorf("%w: location must be %s or a host ID", ErrInvalidSyntheticCheck, model.SyntheticLocationGateway)
+		}
+		hostIDs = append(hostIDs, id)
+	}
+	if len(hostIDs) > 0 {
+		var found int64
+		if err := s.db.Model(&model.Host{}).Where("id IN ?", hostIDs).Count(&found).Error; err != nil {
+			return err
+		}
+		if int(found) != len(hostIDs) {
+			return fmt.Errorf("%w: unknown location host", ErrInvalidSyntheticCheck)
+		}
+	}
+	data, _ := json.Marshal(locations)
+	check.Locations = string(data)
+	return nil
+}
+
+// validateSyntheticCheck checks a check's target and assertions for its type
+func validateSyntheticCheck(check *model.SyntheticCheck, locations int) error {
+	if check.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSyntheticCheck)
+	}
+	switch check.Type {
+	case model.SyntheticCheckHTTP:
+		u, err := url.Parse(check.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: target must be an http or https URL", ErrInvalidSyntheticCheck)
+		}
+		if check.ExpectedStatus != "" {
+			if _, err := parseStatusRanges(check.ExpectedStatus); err != nil {
+				return fmt.Errorf("%w: expectedStatus: %v", ErrInvalidSyntheticCheck, err)
+			}
+		}
+		if check.BodyRegex != "" {
+			if _, err := regexp.Compile(check.BodyRegex); err != nil {
+				return fmt.Errorf("%w: bodyRegex: %v", ErrInvalidSyntheticCheck, err)
+			}
+		}
+		switch check.Method {
+		case "", "GET", "HEAD", "POST", "OPTIONS":
+		default:
+			return fmt.Errorf("%w: method must be GET, HEAD, POST or OPTIONS", ErrInvalidSyntheticCheck)
+		}
+	case model.SyntheticCheckTCP:
+		if _, port, err := net.SplitHostPort(check.Target); err != nil || port == "" {
+			return fmt.Errorf("%w: target must be host:port", ErrInvalidSyntheticCheck)
+		}
+	case model.SyntheticCheckICMP:
+		if check.Target == "" || strings.ContainsAny(check.Target, "/: ") && net.ParseIP(check.Target) == nil {
+			return fmt.Errorf("%w: target must be a host name or address", ErrInvalidSyntheticCheck)
+		}
+	default:
+		return fmt.Errorf("%w: type must be http, tcp or icmp", ErrInvalidSyntheticCheck)
+	}
+	if check.Type != model.SyntheticCheckHTTP && (check.ExpectedStatus != "" || check.BodyRegex != "" || check.Method != "") {
+		return fmt.Errorf("%w: method, expectedStatus and bodyRegex only apply to http checks", ErrInvalidSyntheticCheck)
+	}
+
+	if check.Interval < minSyntheticInterval || check.Interval > maxSyntheticInterval {
+		return fmt.Errorf("%w: interval must be between %d and %d seconds", ErrInvalidSyntheticCheck, minSyntheticInterval, maxSyntheticInterval)
+	}
+	if check.Timeout < 1 || check.Timeout > maxSyntheticTimeout || check.Timeout > check.Interval {
+		return fmt.Errorf("%w: timeout must be between 1 and %d seconds and no longer than the interval", ErrInvalidSyntheticCheck, maxSyntheticTimeout)
+	}
+	if check.MaxLatency < 0 {
+		return fmt.Errorf("%w: maxLatency must not be negative", ErrInvalidSyntheticCheck)
+	}
+	if check.FailureThreshold < 1 || check.FailureThreshold > locations {
+		return fmt.Errorf("%w: failureThreshold must be between 1 and the number of locations", ErrInvalidSyntheticCheck)
+	}
+	switch check.Severity {
+	case model.AlertSeverityInfo, model.AlertSeverityWarning, model.AlertSeverityCritical:
+	default:
+		return fmt.Errorf("%w: severity must be info, warning or critical", ErrInvalidSyntheticCheck)
+	}
+	return nil
+}
+
+// syntheticAlertRule is the alert rule of a check, which fires when at least
+// the threshold of locations fail
+func syntheticAlertRule(check *model.SyntheticCheck) model.AlertRule {
+	return model.AlertRule{
+		ID:          check.AlertRuleID,
+		UserID:      check.UserID,
+		Name:        fmt.Sprintf("%s: synthetic check down", check.Name),
+		Description: fmt.Sprintf("%s check of %s failing from %d or more locations. Managed by the synthetic check.", check.Type, check.Target, check.FailureThreshold),
+		Enabled:     check.Enabled,
+		TargetType:  "synthetic_check",
+		TargetID:    check.ID.String(),
+		MetricType:  model.AlertMetricSyntheticFailures,
+		Operator:    ">=",
+		Threshold:   float64(check.FailureThreshold),
+		Duration:    int32(check.Interval),
+		Severity:    check.Severity,
+	}
+}
+
+// plan sets the next run of a check, or clears it when the check is disabled
+func (s *SyntheticService) plan(check *model.SyntheticCheck, now time.Time) {
+	check.NextRunAt = nil
+	if check.Enabled {
+		next := now
+		check.NextRunAt = &next
+	}
+}
+
+// resolveAlerts resolves the open alerts of a disabled check, which no longer
+// evaluates its rule
+func (s *SyntheticService) resolveAlerts(check *model.SyntheticCheck) {
+	var open []model.Alert
+	if err := s.db.Where("rule_id = ? AND status IN ?", check.AlertRuleID, []model.AlertStatus{model.AlertStatusFiring, model.AlertStatusSilenced}).Find(&open).Error; err != nil {
+		s.logger.Error("failed to load synthetic check alerts", zap.String("checkId", check.ID.String()), zap.Error(err))
+		return
+	}
+	for i := range open {
+		if err := s.engine.resolveAlert(&open[i]); err != nil {
+			s.logger.Error("failed to resolve synthetic check alert", zap.String("alertId", open[i].ID.String()), zap.Error(err))
+		}
+	}
+}
+
+// ============== Runs ==============
+
+// Run runs due checks until ctx is cancelled and prunes old results hourly
+func (s *SyntheticService) Run(ctx context.Context) {
+	ticker := time.NewTicker(syntheticTickInterval)
+	defer ticker.Stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var lastPrune time.Time
+	for {
+		s.runDue(ctx, &wg)
+		if time.Since(lastPrune) >= syntheticPruneInterval {
+			lastPrune = time.Now()
+			if deleted, err := s.Prune(); err != nil {
+				s.logger.Error("failed to prune synthetic results", zap.Error(err))
+			} else if deleted > 0 {
+				s.logger.Info("pruned synthetic results", zap.Int64("deleted", deleted))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDue starts every enabled check whose next run has come, as many at once
+// as there are free slots. A check is claimed by moving its next run, so each
+// run happens once even with several gateway replicas.
+func (s *SyntheticService) runDue(ctx context.Context, wg *sync.WaitGroup) {
+	free := cap(s.slots) - len(s.slots)
+	if free == 0 {
+		return
+	}
+	now := time.Now()
+	var due []model.SyntheticCheck
+	if err := s.db.Where("enabled = ? AND next_run_at <= ?", true, now).Order("next_run_at").Limit(free).Find(&due).Error; err != nil {
+		s.logger.Error("failed to load synthetic checks", zap.Error(err))
+		return
+	}
+
+	for i := range due {
+		check := due[i]
+		next := now.Add(time.Duration(check.Interval) * time.Second)
+		claim := s.db.Model(&model.SyntheticCheck{}).
+			Where("id = ? AND next_run_at = ?", check.ID, *check.NextRunAt).
+			Update("next_run_at", next)
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+		s.slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-s.slots }()
+			if _, err := s.run(ctx, &check); err != nil {
+				s.logger.Error("failed to run synthetic check", zap.String("checkId", check.ID.String()), zap.Error(err))
+			}
+		}()
+	}
+}
+
+// RunNow runs one of the user's checks at once and returns its results
+func (s *SyntheticService) RunNow(ctx context.Context, userID, id uuid.UUID) ([]model.SyntheticResult, error) {
+	check, err := s.find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.run(ctx, check)
+}
+
+// run probes a check from each of its locations at once, records the results
+// with the same time, updates the check's status and evaluates its alert rule
+// with the number of failing locations
+func (s *SyntheticService) run(ctx context.Context, check *model.SyntheticCheck) ([]model.SyntheticResult, error) {
+	spec := &model.SyntheticProbeSpec{
+		Type:      check.Type,
+		Target:    check.Target,
+		Method:    check.Method,
+		Timeout:   check.Timeout,
+		BodyRegex: check.BodyRegex,
+	}
+	locations := check.Response().Locations
+	checkedAt := time.Now()
+	results := make([]model.SyntheticResult, len(locations))
+
+	var wg sync.WaitGroup
+	for i, location := range locations {
+		wg.Add(1)
+		go func(i int, location string) {
+			defer wg.Done()
+			probe := s.probe(ctx, location, spec)
+			result := model.SyntheticResult{
+				ID:         uuid.New(),
+				CheckID:    check.ID,
+				Location:   location,
+				Latency:    probe.Latency,
+				StatusCode: probe.StatusCode,
+				Error:      syntheticAssert(check, &probe),
+				CheckedAt:  checkedAt,
+			}
+			result.Success = result.Error == ""
+			results[i] = result
+		}(i, location)
+	}
+	wg.Wait()
+
+	if err := s.db.Create(&results).Error; err != nil {
+		return nil, err
+	}
+
+	failing := 0
+	var slowest *int64
+	var lastError string
+	for i := range results {
+		r := &results[i]
+		if !r.Success {
+			failing++
+			lastError = fmt.Sprintf("%s: %s", r.Location, r.Error)
+		} else if slowest == nil || r.Latency > *slowest {
+			slowest = &r.Latency
+		}
+	}
+	status := model.SyntheticCheckUp
+	switch {
+	case failing >= check.FailureThreshold:
+		status = model.SyntheticCheckDown
+	case failing > 0:
+		status = model.SyntheticCheckDegraded
+	}
+	err := s.db.Model(check).Updates(map[string]interface{}{
+		"status":          status,
+		"failing_count":   failing,
+		"last_latency":    slowest,
+		"last_error":      lastError,
+		"last_checked_at": checkedAt,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if check.Enabled {
+		var rule model.AlertRule
+		if err := s.db.Where("id = ?", check.AlertRuleID).First(&rule).Error; err != nil {
+			s.logger.Error("failed to load synthetic check alert rule", zap.String("checkId", check.ID.String()), zap.Error(err))
+		} else if rule.Enabled && (rule.SilencedUntil == nil || !rule.SilencedUntil.After(checkedAt)) {
+			if err := s.engine.EvaluateValue(&rule, float64(failing)); err != nil {
+				s.logger.Error("failed to evaluate synthetic check alert rule", zap.String("checkId", check.ID.String()), zap.Error(err))
+			}
+		}
+	}
+	return results, nil
+}
+
+// probe runs a probe from the gateway, or from the agent of a location host
+func (s *SyntheticService) probe(ctx context.Context, location string, spec *model.SyntheticProbeSpec) model.SyntheticProbeResult {
+	if location == model.SyntheticLocationGateway {
+		return RunSyntheticProbe(ctx, spec)
+	}
+
+	hostID, err := uuid.Parse(location)
+	if err != nil {
+		return model.SyntheticProbeResult{Error: "invalid location"}
+	}
+	var host model.Host
+	if err := s.db.Where("id = ?", hostID).First(&host).Error; err != nil {
+		return model.SyntheticProbeResult{Error: "location host not found"}
+	}
+	if !AgentAvailable(&host) {
+		return model.SyntheticProbeResult{Error: "agent of location host is offline"}
+	}
+
+	timeout := time.Duration(spec.Timeout)*time.Second + syntheticAgentGrace
+	cmd, err := s.commands.Dispatch(ctx, hostID, nil, model.AgentCommandSyntheticProbe, spec, timeout)
+	if err != nil {
+		return model.SyntheticProbeResult{Error: err.Error()}
+	}
+	if cmd.Status != model.AgentCommandStatusCompleted {
+		msg := cmd.ErrorMessage
+		if msg == "" {
+			msg = fmt.Sprintf("agent probe %s", cmd.Status)
+		}
+		return model.SyntheticProbeResult{Error: msg}
+	}
+	var result model.SyntheticProbeResult
+	if err := json.Unmarshal([]byte(cmd.Output), &result); err != nil {
+		return model.SyntheticProbeResult{Error: "invalid agent probe result"}
+	}
+	return result
+}
+
+// Prune deletes results older than the retention setting and returns the number deleted
+func (s *SyntheticService) Prune() (int64, error) {
+	retention := s.settings.Duration(model.SettingSyntheticRetention)
+	if retention <= 0 {
+		return 0, nil
+	}
+	result := s.db.Where("checked_at < ?", time.Now().Add(-retention)).Delete(&model.SyntheticResult{})
+	return result.RowsAffected, result.Error
+}
+
+// ============== Results ==============
+
+// Results lists the results of one of the user's checks, newest first
+func (s *SyntheticService) Results(userID, id uuid.UUID, filter *model.SyntheticResultFilter) ([]model.SyntheticResult, int64, error) {
+	if _, err := s.find(userID, id); err != nil {
+		return nil, 0, err
+	}
+	query := s.db.Model(&model.SyntheticResult{}).Where("check_id = ?", id)
+	if filter.Location != "" {
+		query = query.Where("location = ?", filter.Location)
+	}
+	if filter.Success != nil {
+		query = query.Where("success = ?", *filter.Success)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("checked_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("checked_at < ?", filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var results []model.SyntheticResult
+	if err := query.Order("checked_at DESC, location").Limit(filter.Limit).Offset(filter.Offset).Find(&results).Error; err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+// Uptime returns the uptime of one of the user's checks between since and
+// until: per location the share of succeeding probes, and overall the share
+// of runs in which the check was not down
+func (s *SyntheticService) Uptime(userID, id uuid.UUID, since, until time.Time) (*model.SyntheticUptime, error) {
+	check, err := s.find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	uptime := &model.SyntheticUptime{CheckID: check.ID, Since: since, Until: until, Locations: []model.SyntheticLocationUptime{}}
+	period := s.db.Model(&model.SyntheticResult{}).Where("check_id = ? AND checked_at >= ? AND checked_at < ?", check.ID, since, until)
+
+	var rows []model.SyntheticLocationUptime
+	err = period.Session(&gorm.Session{}).
+		Select("location, COUNT(*) AS probes, " +
+			"SUM(CASE WHEN success THEN 1 ELSE 0 END) AS successes, " +
+			"COALESCE(AVG(CASE WHEN success THEN latency END), 0) AS avg_latency, " +
+			"COALESCE(MAX(CASE WHEN success THEN latency END), 0) AS max_latency").
+		Group("location").Order("location").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		row.Uptime = uptimePercent(row.Successes, row.Probes)
+		uptime.Locations = append(uptime.Locations, row)
+		uptime.Overall.Probes += row.Probes
+		uptime.Overall.Successes += row.Successes
+		uptime.Overall.AvgLatency += row.AvgLatency * float64(row.Successes)
+		if row.MaxLatency > uptime.Overall.MaxLatency {
+			uptime.Overall.MaxLatency = row.MaxLatency
+		}
+	}
+	if uptime.Overall.Successes > 0 {
+		uptime.Overall.AvgLatency /= float64(uptime.Overall.Successes)
+	}
+
+	// A run is down when at least the threshold of its locations failed
+	runs := period.Session(&gorm.Session{}).
+		Select("checked_at, SUM(CASE WHEN success THEN 0 ELSE 1 END) AS failures").
+		Group("checked_at")
+	var counts struct {
+		Runs int64
+		Down int64
+	}
+	err = s.db.Table("(?) AS runs", runs).
+		Select("COUNT(*) AS runs, COALESCE(SUM(CASE WHEN failures >= ? THEN 1 ELSE 0 END), 0) AS down", check.FailureThreshold).
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	uptime.Overall.Location = "overall"
+	uptime.Overall.Uptime = uptimePercent(counts.Runs-counts.Down, counts.Runs)
+	return uptime, nil
+}
+
+// uptimePercent is the share of up of total in percent, 100 without any
+func uptimePercent(up, total int64) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(up) / float64(total) * 100
+}
@@ -0,0 +1,234 @@
+// Package service provides the HTTP, TCP and ICMP probes of synthetic checks
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// syntheticBodyLimit is how much of a response body the body regex sees
+const syntheticBodyLimit = 1 << 20
+
+// icmpSequence numbers the echo requests of the gateway
+var icmpSequence atomic.Uint32
+
+// RunSyntheticProbe probes an endpoint once from the gateway. Probes that get
+// no answer return a result with an error rather than failing.
+func RunSyntheticProbe(ctx context.Context, spec *model.SyntheticProbeSpec) model.SyntheticProbeResult {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(spec.Timeout)*time.Second)
+	defer cancel()
+
+	started := time.Now()
+	var result model.SyntheticProbeResult
+	var err error
+	switch spec.Type {
+	case model.SyntheticCheckHTTP:
+		err = probeHTTP(ctx, spec, &result)
+	case model.SyntheticCheckTCP:
+		err = probeTCP(ctx, spec.Target)
+	case model.SyntheticCheckICMP:
+		err = probeICMP(ctx, spec.Target)
+	default:
+		err = fmt.Errorf("unknown check type: %s", spec.Type)
+	}
+	result.Latency = time.Since(started).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// probeHTTP requests the target without following redirects, so they can be
+// asserted on, and matches the start of the body against the spec's regex
+func probeHTTP(ctx context.Context, spec *model.SyntheticProbeSpec, result *model.SyntheticProbeResult) error {
+	method := spec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, spec.Target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "myops-synthetic/1.0")
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS12},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, syntheticBodyLimit))
+	if err != nil {
+		return fmt.Errorf("failed to read body: %w", err)
+	}
+	if spec.BodyRegex != "" {
+		re, err := regexp.Compile(spec.BodyRegex)
+		if err != nil {
+			return fmt.Errorf("invalid body regex: %w", err)
+		}
+		matched := re.Match(body)
+		result.BodyMatched = &matched
+	}
+	return nil
+}
+
+// probeTCP opens a connection to host:port
+func probeTCP(ctx context.Context, target string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeICMP sends an echo request and waits for its reply. It needs a raw
+// socket, so the gateway must run as root or with CAP_NET_RAW.
+func probeICMP(ctx context.Context, target string) error {
+	addr, err := net.DefaultResolver.LookupIPAddr(ctx, target)
+	if err != nil {
+		return err
+	}
+	if len(addr) == 0 {
+		return fmt.Errorf("no address for %s", target)
+	}
+	ip := addr[0].IP
+
+	network, request, reply := "ip4:icmp", byte(8), byte(0)
+	if ip.To4() == nil {
+		network, request, reply = "ip6:ipv6-icmp", 128, 129
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, ip.String())
+	if err != nil {
+		return fmt.Errorf("failed to open icmp socket: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	id := uint16(os.Getpid())
+	seq := uint16(icmpSequence.Add(1))
+	msg := make([]byte, 16)
+	msg[0] = request
+	binary.BigEndian.PutUint16(msg[4:], id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	copy(msg[8:], "myops-sm")
+	if request == 8 {
+		// The kernel computes ICMPv6 checksums
+		binary.BigEndian.PutUint16(msg[2:], icmpChecksum(msg))
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return fmt.Errorf("failed to send echo request: %w", err)
+	}
+
+	ipConn := conn.(*net.IPConn)
+	buf := make([]byte, 1500)
+	for {
+		// ReadFrom strips the IPv4 header
+		n, _, err := ipConn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return fmt.Errorf("no echo reply from %s", ip)
+			}
+			return err
+		}
+		if n >= 8 && buf[0] == reply && binary.BigEndian.Uint16(buf[4:]) == id && binary.BigEndian.Uint16(buf[6:]) == seq {
+			return nil
+		}
+	}
+}
+
+// icmpChecksum is the internet checksum of an ICMPv4 message
+func icmpChecksum(msg []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(msg); i += 2 {
+		sum += uint32(msg[i])<<8 | uint32(msg[i+1])
+	}
+	if len(msg)%2 == 1 {
+		sum += uint32(msg[len(msg)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// syntheticAssert checks a probe result against the check's assertions and
+// returns why it failed, or an empty string
+func syntheticAssert(check *model.SyntheticCheck, result *model.SyntheticProbeResult) string {
+	if result.Error != "" {
+		return result.Error
+	}
+	if check.Type == model.SyntheticCheckHTTP {
+		if !statusExpected(check.ExpectedStatus, result.StatusCode) {
+			return fmt.Sprintf("unexpected status code %d", result.StatusCode)
+		}
+		if check.BodyRegex != "" && (result.BodyMatched == nil || !*result.BodyMatched) {
+			return "body does not match " + check.BodyRegex
+		}
+	}
+	if check.MaxLatency > 0 && result.Latency > int64(check.MaxLatency) {
+		return fmt.Sprintf("latency %dms over %dms", result.Latency, check.MaxLatency)
+	}
+	return ""
+}
+
+// statusExpected reports whether a status code is in a comma separated list of
+// codes and ranges such as 200-299,301; 2xx and 3xx when the list is empty
+func statusExpected(expected string, code int) bool {
+	if expected == "" {
+		return code >= 200 && code < 400
+	}
+	ranges, _ := parseStatusRanges(expected)
+	for _, r := range ranges {
+		if code >= r[0] && code <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStatusRanges parses a comma separated list of status codes and ranges
+func parseStatusRanges(expected string) ([][2]int, error) {
+	var ranges [][2]int
+	for _, part := range strings.Split(expected, ",") {
+		part = strings.TrimSpace(part)
+		var lo, hi int
+		if _, err := fmt.Sscanf(part, "%d-%d", &lo, &hi); err != nil {
+			if _, err := fmt.Sscanf(part, "%d", &lo); err != nil {
+				return nil, fmt.Errorf("invalid status code %q", part)
+			}
+			hi = lo
+		}
+		if lo < 100 || hi > 599 || lo > hi {
+			return nil, fmt.Errorf("invalid status code range %q", part)
+		}
+		ranges = append(ranges, [2]int{lo, hi})
+	}
+	return ranges, nil
+}
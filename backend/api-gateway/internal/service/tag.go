@@ -0,0 +1,174 @@
+// Package service provides tags on clusters, data sources, dashboards, alert
+// rules and Helm releases
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxTagsPerResource bounds the tags set on a resource in one request
+	maxTagsPerResource = 50
+	// maxBulkTagResources bounds the resources one bulk operation can change
+	maxBulkTagResources = 500
+)
+
+var (
+	// ErrInvalidTags is returned for tags that are not valid label keys and values
+	ErrInvalidTags = errors.New("invalid tags")
+	// ErrTaggedResourceNotFound is returned when a resource does not exist or the
+	// user may not tag it
+	ErrTaggedResourceNotFound = errors.New("resource not found")
+)
+
+// TagService manages the tags of resources. Users tag the resources they own;
+// holders of tags.manage may tag any resource.
+type TagService struct {
+	db   *gorm.DB
+	tags TagRepository
+}
+
+// NewTagService creates a new tag service
+func NewTagService(db *gorm.DB, tags TagRepository) *TagService {
+	return &TagService{db: db, tags: tags}
+}
+
+// owner returns the owner resources must have for userID to tag them, or nil
+// when the user may tag any resource
+func (s *TagService) owner(userID uuid.UUID) *uuid.UUID {
+	if model.UserHasPermission(s.db, userID, "tags", "manage", nil, "").Allowed {
+		return nil
+	}
+	return &userID
+}
+
+// Get returns the tags of the resources in ids the user may tag, by resource ID.
+// Other resources are left out.
+func (s *TagService) Get(ctx context.Context, userID uuid.UUID, resourceType model.TagResourceType, ids []uuid.UUID) (map[uuid.UUID]map[string]string, error) {
+	if !resourceType.Valid() {
+		return nil, fmt.Errorf("%w: resources of type %q cannot be tagged", ErrInvalidTags, resourceType)
+	}
+	visible, err := s.tags.Resolve(ctx, resourceType, ids, s.owner(userID))
+	if err != nil {
+		return nil, err
+	}
+	return s.tags.FindMany(ctx, resourceType, visible)
+}
+
+// Set replaces every tag of a resource and returns the new tags
+func (s *TagService) Set(ctx context.Context, userID uuid.UUID, resourceType model.TagResourceType, id uuid.UUID, tags map[string]string) (map[string]string, error) {
+	if !resourceType.Valid() {
+		return nil, fmt.Errorf("%w: resources of type %q cannot be tagged", ErrInvalidTags, resourceType)
+	}
+	if err := validateTags(tags); err != nil {
+		return nil, err
+	}
+	found, err := s.tags.Resolve(ctx, resourceType, []uuid.UUID{id}, s.owner(userID))
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrTaggedResourceNotFound
+	}
+
+	if err := s.tags.Replace(ctx, resourceType, id, tags, userID); err != nil {
+		return nil, err
+	}
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	return tags, nil
+}
+
+// Bulk adds and removes tags on many resources. Resources that do not exist or
+// the user may not tag are reported as failed and the rest are still changed.
+func (s *TagService) Bulk(ctx context.Context, userID uuid.UUID, req *model.BulkTagRequest) (*model.BulkTagResult, error) {
+	if len(req.Resources) == 0 {
+		return nil, fmt.Errorf("%w: no resources", ErrInvalidTags)
+	}
+	if len(req.Resources) > maxBulkTagResources {
+		return nil, fmt.Errorf("%w: at most %d resources can be changed at once", ErrInvalidTags, maxBulkTagResources)
+	}
+	if len(req.Add) == 0 && len(req.Remove) == 0 {
+		return nil, fmt.Errorf("%w: nothing to add or remove", ErrInvalidTags)
+	}
+	if err := validateTags(req.Add); err != nil {
+		return nil, err
+	}
+	for _, key := range req.Remove {
+		if err := sanitize.Labels(map[string]string{key: ""}); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTags, err)
+		}
+	}
+
+	// A resource listed twice would be upserted twice in one statement
+	byType := make(map[model.TagResourceType][]uuid.UUID)
+	seen := make(map[model.TaggedResource]bool, len(req.Resources))
+	for _, resource := range req.Resources {
+		if !resource.Type.Valid() {
+			return nil, fmt.Errorf("%w: resources of type %q cannot be tagged", ErrInvalidTags, resource.Type)
+		}
+		if !seen[resource] {
+			seen[resource] = true
+			byType[resource.Type] = append(byType[resource.Type], resource.ID)
+		}
+	}
+
+	result := &model.BulkTagResult{}
+	owner := s.owner(userID)
+	for _, resourceType := range model.TagResourceTypes {
+		ids := byType[resourceType]
+		if len(ids) == 0 {
+			continue
+		}
+		found, err := s.tags.Resolve(ctx, resourceType, ids, owner)
+		if err != nil {
+			return nil, err
+		}
+		taggable := make(map[uuid.UUID]bool, len(found))
+		for _, id := range found {
+			taggable[id] = true
+		}
+		for _, id := range ids {
+			if !taggable[id] {
+				result.Failed = append(result.Failed, model.BulkTagFailure{
+					Resource: model.TaggedResource{Type: resourceType, ID: id},
+					Error:    ErrTaggedResourceNotFound.Error(),
+				})
+			}
+		}
+
+		if err := s.tags.Apply(ctx, resourceType, found, req.Add, req.Remove, userID); err != nil {
+			return nil, err
+		}
+		result.Updated += len(found)
+	}
+	return result, nil
+}
+
+// Keys returns the tag keys in use on the user's resources, optionally of one
+// type only, for suggesting tags and filters
+func (s *TagService) Keys(ctx context.Context, userID uuid.UUID, resourceType model.TagResourceType) ([]model.TagKey, error) {
+	if resourceType != "" && !resourceType.Valid() {
+		return nil, fmt.Errorf("%w: resources of type %q cannot be tagged", ErrInvalidTags, resourceType)
+	}
+	return s.tags.Keys(ctx, userID, resourceType)
+}
+
+// validateTags checks that tags are valid label keys and values and not too many
+func validateTags(tags map[string]string) error {
+	if len(tags) > maxTagsPerResource {
+		return fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidTags, maxTagsPerResource)
+	}
+	if err := sanitize.Labels(tags); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTags, err)
+	}
+	return nil
+}
@@ -0,0 +1,782 @@
+// Package service provides ticketing system integrations: issues opened,
+// updated and resolved in Jira or ServiceNow as alerts fire and resolve
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/db"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// JobTypeTicketSync opens, updates or resolves the issue of one alert in one integration
+	JobTypeTicketSync = "ticketing.sync"
+
+	ticketRequestTimeout = 15 * time.Second
+	ticketSyncInterval   = 2 * time.Minute
+	ticketSyncBatchSize  = 100
+	ticketJobAttempts    = 6
+)
+
+// Default issue templates, rendered over ticketTemplateData
+const (
+	defaultTicketSummary     = `[{{.Alert.Severity}}] {{.Alert.Title}}`
+	defaultTicketDescription = `{{.Alert.Description}}
+
+Severity: {{.Alert.Severity}}
+Value: {{printf "%.2f" .Alert.Value}} (threshold {{printf "%.2f" .Alert.Threshold}})
+Started: {{.Alert.StartedAt.UTC.Format "2006-01-02 15:04:05 MST"}}
+Alert ID: {{.Alert.ID}}`
+	defaultJiraIssueType = "Task"
+)
+
+// Actions of ticket sync jobs
+const (
+	ticketActionOpen    = "open"
+	ticketActionResolve = "resolve"
+)
+
+var (
+	// ErrInvalidTicketIntegration is returned for integrations that cannot be saved
+	ErrInvalidTicketIntegration = errors.New("invalid ticketing integration")
+	// ErrTicketIntegrationNotFound is returned when the integration does not exist
+	ErrTicketIntegrationNotFound = errors.New("ticketing integration not found")
+	// ErrTicketAlertNotFound is returned when the alert does not exist
+	ErrTicketAlertNotFound = errors.New("alert not found")
+	// ErrTicketUnauthorized is returned for inbound webhooks without the integration's token
+	ErrTicketUnauthorized = errors.New("invalid inbound token")
+	// ErrTicketingFailed is returned when the ticketing system refuses a request
+	ErrTicketingFailed = errors.New("ticketing system request failed")
+)
+
+// ticketJob is the payload of a ticket sync job
+type ticketJob struct {
+	Action        string    `json:"action"`
+	AlertID       uuid.UUID `json:"alertId"`
+	IntegrationID uuid.UUID `json:"integrationId"`
+}
+
+// ticketTemplateData is what issue templates are rendered over
+type ticketTemplateData struct {
+	Alert       *model.Alert
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// TicketingService keeps issues in ticketing systems in step with alerts. Fired
+// alerts open an issue in each enabled integration of their owner, fired again
+// after a silence they comment on it, and resolved they resolve it; the job
+// queue retries the calls. Open issues are polled, or synced when the ticketing
+// system calls the integration's inbound webhook, and an issue closed there
+// resolves its alert.
+type TicketingService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	jobs   *JobQueue
+	alerts *AlertEngine
+	http   *http.Client
+}
+
+// NewTicketingService creates a new ticketing service and registers the ticket
+// sync job with the queue
+func NewTicketingService(db *gorm.DB, logger *zap.Logger, jobs *JobQueue, alerts *AlertEngine) *TicketingService {
+	s := &TicketingService{
+		db:     db,
+		logger: logger,
+		jobs:   jobs,
+		alerts: alerts,
+		http:   &http.Client{Timeout: ticketRequestTimeout},
+	}
+	jobs.Register(JobTypeTicketSync, s.syncJob, JobTypeOptions{
+		MaxAttempts:       ticketJobAttempts,
+		VisibilityTimeout: 4 * ticketRequestTimeout,
+		RetryBase:         30 * time.Second,
+		RetryMax:          30 * time.Minute,
+	})
+	return s
+}
+
+// ============== Integrations ==============
+
+// Create validates and stores an integration. The returned token authenticates
+// the integration's inbound webhook and is only available here.
+func (s *TicketingService) Create(userID uuid.UUID, req *model.CreateTicketIntegrationRequest) (*model.TicketIntegration, string, error) {
+	integration := &model.TicketIntegration{
+		UserID:              userID,
+		Name:                req.Name,
+		Provider:            req.Provider,
+		BaseURL:             req.BaseURL,
+		Username:            req.Username,
+		Token:               req.Token,
+		Enabled:             req.Enabled == nil || *req.Enabled,
+		Project:             req.Project,
+		IssueType:           req.IssueType,
+		SummaryTemplate:     req.SummaryTemplate,
+		DescriptionTemplate: req.DescriptionTemplate,
+		ResolveTransition:   req.ResolveTransition,
+		SyncStatus:          req.SyncStatus == nil || *req.SyncStatus,
+	}
+	if err := applyTicketMapping(integration, req.Severities, req.Fields); err != nil {
+		return nil, "", err
+	}
+	if err := validateTicketIntegration(integration); err != nil {
+		return nil, "", err
+	}
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return nil, "", err
+	}
+	integration.InboundTokenHash = hash
+	if err := s.db.Create(integration).Error; err != nil {
+		return nil, "", err
+	}
+	return integration, token, nil
+}
+
+// List lists the user's integrations
+func (s *TicketingService) List(userID uuid.UUID) ([]model.TicketIntegration, error) {
+	integrations := []model.TicketIntegration{}
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&integrations).Error
+	return integrations, err
+}
+
+// Get gets an integration of the user
+func (s *TicketingService) Get(userID, id uuid.UUID) (*model.TicketIntegration, error) {
+	var integration model.TicketIntegration
+	err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&integration).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTicketIntegrationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &integration, nil
+}
+
+// Update applies an update request to an integration. The provider cannot change.
+func (s *TicketingService) Update(userID, id uuid.UUID, req *model.UpdateTicketIntegrationRequest) (*model.TicketIntegration, error) {
+	integration, err := s.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		integration.Name = *req.Name
+	}
+	if req.BaseURL != nil {
+		integration.BaseURL = *req.BaseURL
+	}
+	if req.Username != nil {
+		integration.Username = *req.Username
+	}
+	if req.Token != nil {
+		integration.Token = *req.Token
+	}
+	if req.Enabled != nil {
+		integration.Enabled = *req.Enabled
+	}
+	if req.Project != nil {
+		integration.Project = *req.Project
+	}
+	if req.IssueType != nil {
+		integration.IssueType = *req.IssueType
+	}
+	if req.SummaryTemplate != nil {
+		integration.SummaryTemplate = *req.SummaryTemplate
+	}
+	if req.DescriptionTemplate != nil {
+		integration.DescriptionTemplate = *req.DescriptionTemplate
+	}
+	if req.ResolveTransition != nil {
+		integration.ResolveTransition = *req.ResolveTransition
+	}
+	if req.SyncStatus != nil {
+		integration.SyncStatus = *req.SyncStatus
+	}
+	if req.Severities != nil || req.Fields != nil {
+		current := integration.Response()
+		severities, fields := current.Severities, current.Fields
+		if req.Severities != nil {
+			severities = *req.Severities
+		}
+		if req.Fields != nil {
+			fields = *req.Fields
+		}
+		if err := applyTicketMapping(integration, severities, fields); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateTicketIntegration(integration); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(integration).Error; err != nil {
+		return nil, err
+	}
+	return integration, nil
+}
+
+// Delete deletes an integration and its links to alerts. Issues it opened stay
+// in the ticketing system.
+func (s *TicketingService) Delete(userID, id uuid.UUID) error {
+	integration, err := s.Get(userID, id)
+	if err != nil {
+		return err
+	}
+	return db.DeleteWithChildren(s.db, integration, "integration_id", integration.ID, &model.AlertTicket{})
+}
+
+// RotateInboundToken replaces the token of an integration's inbound webhook
+func (s *TicketingService) RotateInboundToken(userID, id uuid.UUID) (string, error) {
+	integration, err := s.Get(userID, id)
+	if err != nil {
+		return "", err
+	}
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.Model(integration).Update("inbound_token_hash", hash).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Test checks the integration's credentials, and for Jira its project, without
+// opening an issue
+func (s *TicketingService) Test(ctx context.Context, userID, id uuid.UUID) error {
+	integration, err := s.Get(userID, id)
+	if err != nil {
+		return err
+	}
+	client, err := newTicketClient(s.http, integration)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTicketIntegration, err)
+	}
+	if err := client.Check(ctx); err != nil {
+		return fmt.Errorf("%w: %v", ErrTicketingFailed, err)
+	}
+	return nil
+}
+
+// applyTicketMapping validates and stores the severities and field templates of an integration
+func applyTicketMapping(integration *model.TicketIntegration, severities []model.AlertSeverity, fields map[string]string) error {
+	for _, severity := range severities {
+		switch severity {
+		case model.AlertSeverityInfo, model.AlertSeverityWarning, model.AlertSeverityCritical:
+		default:
+			return fmt.Errorf("%w: unknown severity %q", ErrInvalidTicketIntegration, severity)
+		}
+	}
+	for name, text := range fields {
+		if name == "" {
+			return fmt.Errorf("%w: field names cannot be empty", ErrInvalidTicketIntegration)
+		}
+		if _, err := parseTicketTemplate(name, text); err != nil {
+			return fmt.Errorf("%w: field %s: %v", ErrInvalidTicketIntegration, name, err)
+		}
+	}
+	if len(severities) == 0 {
+		integration.Severities = ""
+	} else {
+		severitiesJSON, _ := json.Marshal(severities)
+		integration.Severities = string(severitiesJSON)
+	}
+	if len(fields) == 0 {
+		integration.Fields = ""
+	} else {
+		fieldsJSON, _ := json.Marshal(fields)
+		integration.Fields = string(fieldsJSON)
+	}
+	return nil
+}
+
+func validateTicketIntegration(integration *model.TicketIntegration) error {
+	if integration.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidTicketIntegration)
+	}
+	switch integration.Provider {
+	case model.TicketProviderJira:
+		if integration.Project == "" {
+			return fmt.Errorf("%w: project is required for Jira", ErrInvalidTicketIntegration)
+		}
+		if integration.IssueType == "" {
+			integration.IssueType = defaultJiraIssueType
+		}
+	case model.TicketProviderServiceNow:
+		if integration.IssueType == "" {
+			integration.IssueType = defaultServiceNowTable
+		}
+	default:
+		return fmt.Errorf("%w: provider must be jira or servicenow", ErrInvalidTicketIntegration)
+	}
+	u, err := url.Parse(integration.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: baseUrl must be an http or https URL", ErrInvalidTicketIntegration)
+	}
+	if integration.Token == "" {
+		return fmt.Errorf("%w: token is required", ErrInvalidTicketIntegration)
+	}
+	if _, err := parseTicketTemplate("summary", integration.SummaryTemplate); err != nil {
+		return fmt.Errorf("%w: summaryTemplate: %v", ErrInvalidTicketIntegration, err)
+	}
+	if _, err := parseTicketTemplate("description", integration.DescriptionTemplate); err != nil {
+		return fmt.Errorf("%w: descriptionTemplate: %v", ErrInvalidTicketIntegration, err)
+	}
+	return nil
+}
+
+// ============== Alert lifecycle ==============
+
+// HandleEvent queues the issue updates of a fired or resolved alert for the
+// enabled integrations of its owner. It is registered as an event bus handler;
+// problems are logged.
+func (s *TicketingService) HandleEvent(userID uuid.UUID, event *model.PlatformEvent) {
+	var action string
+	switch event.Type {
+	case model.EventAlertFired:
+		action = ticketActionOpen
+	case model.EventAlertResolved:
+		action = ticketActionResolve
+	default:
+		return
+	}
+	alert, ok := event.Data.(*model.Alert)
+	if !ok {
+		return
+	}
+
+	var integrations []model.TicketIntegration
+	if err := s.db.Where("user_id = ? AND enabled = ?", userID, true).Find(&integrations).Error; err != nil {
+		s.logger.Error("failed to load ticketing integrations", zap.String("alertId", alert.ID.String()), zap.Error(err))
+		return
+	}
+	for i := range integrations {
+		integration := &integrations[i]
+		if action == ticketActionOpen && !ticketsSeverity(integration, alert.Severity) {
+			continue
+		}
+		if action == ticketActionResolve {
+			var open int64
+			s.db.Model(&model.AlertTicket{}).
+				Where("alert_id = ? AND integration_id = ? AND status = ?", alert.ID, integration.ID, model.AlertTicketOpen).
+				Count(&open)
+			if open == 0 {
+				continue
+			}
+		}
+		s.enqueue(action, alert.ID, integration.ID)
+	}
+}
+
+// OpenTicket queues opening an issue for an alert in one of the user's
+// integrations, whatever the alert's severity. An alert that has an issue in
+// the integration gets a comment instead.
+func (s *TicketingService) OpenTicket(userID, alertID, integrationID uuid.UUID) error {
+	var alert model.Alert
+	if err := s.db.Select("id").Where("id = ? AND user_id = ?", alertID, userID).First(&alert).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTicketAlertNotFound
+		}
+		return err
+	}
+	integration, err := s.Get(userID, integrationID)
+	if err != nil {
+		return err
+	}
+	if !integration.Enabled {
+		return fmt.Errorf("%w: integration is disabled", ErrInvalidTicketIntegration)
+	}
+	_, err = s.jobs.Enqueue(JobTypeTicketSync, ticketJob{Action: ticketActionOpen, AlertID: alertID, IntegrationID: integrationID}, JobOptions{})
+	return err
+}
+
+// Tickets lists the issues opened for an alert of the user
+func (s *TicketingService) Tickets(userID, alertID uuid.UUID) ([]model.AlertTicket, error) {
+	var alert model.Alert
+	if err := s.db.Select("id").Where("id = ? AND user_id = ?", alertID, userID).First(&alert).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTicketAlertNotFound
+		}
+		return nil, err
+	}
+	tickets := []model.AlertTicket{}
+	err := s.db.Where("alert_id = ?", alertID).Order("created_at").Find(&tickets).Error
+	return tickets, err
+}
+
+func (s *TicketingService) enqueue(action string, alertID, integrationID uuid.UUID) {
+	_, err := s.jobs.Enqueue(JobTypeTicketSync, ticketJob{Action: action, AlertID: alertID, IntegrationID: integrationID}, JobOptions{})
+	if err != nil {
+		s.logger.Error("failed to queue ticket sync",
+			zap.String("action", action),
+			zap.String("alertId", alertID.String()),
+			zap.String("integrationId", integrationID.String()),
+			zap.Error(err),
+		)
+	}
+}
+
+// ticketsSeverity reports whether the integration opens issues for alerts of a severity
+func ticketsSeverity(integration *model.TicketIntegration, severity model.AlertSeverity) bool {
+	severities := integration.Response().Severities
+	if len(severities) == 0 {
+		return true
+	}
+	for _, s := range severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// syncJob opens, comments on or resolves the issue of an alert
+func (s *TicketingService) syncJob(ctx context.Context, job *model.Job) error {
+	var payload ticketJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	var integration model.TicketIntegration
+	if err := s.db.First(&integration, "id = ?", payload.IntegrationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // Deleted while queued
+		}
+		return err
+	}
+	if !integration.Enabled {
+		return nil
+	}
+	var alert model.Alert
+	if err := s.db.First(&alert, "id = ?", payload.AlertID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	client, err := newTicketClient(s.http, &integration)
+	if err != nil {
+		return err
+	}
+
+	var ticket model.AlertTicket
+	err = s.db.Where("alert_id = ? AND integration_id = ?", alert.ID, integration.ID).First(&ticket).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	exists := err == nil
+	final := job.Attempts >= job.MaxAttempts
+
+	switch payload.Action {
+	case ticketActionOpen:
+		if exists {
+			text := fmt.Sprintf("Alert %q is firing again (value %.2f, threshold %.2f).", alert.Title, alert.Value, alert.Threshold)
+			return s.recordTicket(&ticket, client.Comment(ctx, ticketReference(&ticket), text), final)
+		}
+		return s.openTicket(ctx, client, &integration, &alert)
+	case ticketActionResolve:
+		if !exists || ticket.Status != model.AlertTicketOpen {
+			return nil
+		}
+		resolvedAt := time.Now()
+		if alert.ResolvedAt != nil {
+			resolvedAt = *alert.ResolvedAt
+		}
+		text := fmt.Sprintf("Alert %q resolved at %s.", alert.Title, resolvedAt.UTC().Format(time.RFC3339))
+		if err := client.Resolve(ctx, ticketReference(&ticket), text); err != nil {
+			return s.recordTicket(&ticket, err, final)
+		}
+		ticket.Status = model.AlertTicketResolved
+		return s.recordTicket(&ticket, nil, final)
+	default:
+		return fmt.Errorf("unknown ticket action %q", payload.Action)
+	}
+}
+
+// openTicket renders the integration's templates over the alert and opens its issue
+func (s *TicketingService) openTicket(ctx context.Context, client ticketClient, integration *model.TicketIntegration, alert *model.Alert) error {
+	summary, description, fields, err := renderTicket(integration, alert)
+	if err != nil {
+		// Templates are validated when saved, so this only fails on the alert's data
+		s.logger.Error("failed to render ticket",
+			zap.String("integrationId", integration.ID.String()),
+			zap.String("alertId", alert.ID.String()),
+			zap.Error(err),
+		)
+		return nil
+	}
+	ref, err := client.Create(ctx, summary, description, fields)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	ticket := &model.AlertTicket{
+		AlertID:       alert.ID,
+		IntegrationID: integration.ID,
+		Provider:      integration.Provider,
+		ExternalID:    ref.ID,
+		ExternalKey:   ref.Key,
+		URL:           ref.URL,
+		Status:        model.AlertTicketOpen,
+		LastSyncedAt:  &now,
+	}
+	if err := s.db.Create(ticket).Error; err != nil {
+		// Retrying would open a second issue
+		s.logger.Error("failed to record ticket",
+			zap.String("alertId", alert.ID.String()),
+			zap.String("ticket", ref.Key),
+			zap.Error(err),
+		)
+		return nil
+	}
+	s.logger.Info("opened ticket for alert",
+		zap.String("alertId", alert.ID.String()),
+		zap.String("provider", string(integration.Provider)),
+		zap.String("ticket", ref.Key),
+	)
+	return nil
+}
+
+// recordTicket saves a ticket after an update. A failed update is recorded on
+// the ticket once the job is out of attempts, and returned for a retry.
+func (s *TicketingService) recordTicket(ticket *model.AlertTicket, updateErr error, final bool) error {
+	if updateErr != nil && !final {
+		return updateErr
+	}
+	now := time.Now()
+	ticket.LastSyncedAt = &now
+	ticket.Error = ""
+	if updateErr != nil {
+		ticket.Error = updateErr.Error()
+	}
+	if err := s.db.Save(ticket).Error; err != nil {
+		return err
+	}
+	return updateErr
+}
+
+// renderTicket renders an integration's summary, description and field
+// templates over an alert. Fields rendering a JSON object or array are sent as
+// JSON, such as {"name": "High"} for a Jira priority.
+func renderTicket(integration *model.TicketIntegration, alert *model.Alert) (string, string, map[string]interface{}, error) {
+	data := ticketTemplateData{Alert: alert, Labels: map[string]string{}, Annotations: map[string]string{}}
+	if alert.Labels != "" {
+		json.Unmarshal([]byte(alert.Labels), &data.Labels)
+	}
+	if alert.Annotations != "" {
+		json.Unmarshal([]byte(alert.Annotations), &data.Annotations)
+	}
+
+	summaryTemplate := integration.SummaryTemplate
+	if summaryTemplate == "" {
+		summaryTemplate = defaultTicketSummary
+	}
+	summary, err := renderTicketTemplate("summary", summaryTemplate, data)
+	if err != nil {
+		return "", "", nil, err
+	}
+	descriptionTemplate := integration.DescriptionTemplate
+	if descriptionTemplate == "" {
+		descriptionTemplate = defaultTicketDescription
+	}
+	description, err := renderTicketTemplate("description", descriptionTemplate, data)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	fields := map[string]interface{}{}
+	for name, text := range integration.Response().Fields {
+		value, err := renderTicketTemplate(name, text, data)
+		if err != nil {
+			return "", "", nil, err
+		}
+		trimmed := strings.TrimSpace(value)
+		if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+			fields[name] = json.RawMessage(trimmed)
+		} else {
+			fields[name] = value
+		}
+	}
+	// Summaries are one line in both systems
+	summary = strings.Join(strings.Fields(summary), " ")
+	return summary, description, fields, nil
+}
+
+func parseTicketTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=zero").Parse(text)
+}
+
+func renderTicketTemplate(name, text string, data ticketTemplateData) (string, error) {
+	tmpl, err := parseTicketTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func ticketReference(ticket *model.AlertTicket) *ticketRef {
+	return &ticketRef{ID: ticket.ExternalID, Key: ticket.ExternalKey, URL: ticket.URL}
+}
+
+// ============== Status sync ==============
+
+// Run polls the status of open issues until ctx is cancelled
+func (s *TicketingService) Run(ctx context.Context) {
+	ticker := time.NewTicker(ticketSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.SyncOpen(ctx)
+		}
+	}
+}
+
+// SyncOpen fetches the status of the open issues of integrations that sync it,
+// least recently synced first, and resolves the alerts whose issue is closed
+func (s *TicketingService) SyncOpen(ctx context.Context) {
+	var integrations []model.TicketIntegration
+	if err := s.db.Where("enabled = ? AND sync_status = ?", true, true).Find(&integrations).Error; err != nil {
+		s.logger.Error("failed to load ticketing integrations", zap.Error(err))
+		return
+	}
+	for i := range integrations {
+		integration := &integrations[i]
+		client, err := newTicketClient(s.http, integration)
+		if err != nil {
+			continue
+		}
+		var tickets []model.AlertTicket
+		err = s.db.Where("integration_id = ? AND status = ?", integration.ID, model.AlertTicketOpen).
+			Order("last_synced_at").Limit(ticketSyncBatchSize).Find(&tickets).Error
+		if err != nil {
+			s.logger.Error("failed to load open tickets", zap.String("integrationId", integration.ID.String()), zap.Error(err))
+			continue
+		}
+		for j := range tickets {
+			if ctx.Err() != nil {
+				return
+			}
+			s.syncTicket(ctx, client, integration, &tickets[j])
+		}
+		now := time.Now()
+		s.db.Model(integration).Update("last_synced_at", now)
+	}
+}
+
+// HandleInbound authenticates a webhook the ticketing system sent about one of
+// its issues, a Jira issue event or a ServiceNow record, and syncs the issue's
+// status. The payload only identifies the issue; its status is fetched from the
+// ticketing system. Issues no alert opened are ignored.
+func (s *TicketingService) HandleInbound(ctx context.Context, integrationID uuid.UUID, token string, body []byte) error {
+	var integration model.TicketIntegration
+	if err := s.db.First(&integration, "id = ?", integrationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTicketUnauthorized
+		}
+		return err
+	}
+	if token == "" || integration.InboundTokenHash == "" ||
+		subtle.ConstantTimeCompare([]byte(hashSecretToken(token)), []byte(integration.InboundTokenHash)) != 1 {
+		return ErrTicketUnauthorized
+	}
+	if !integration.Enabled || !integration.SyncStatus {
+		return nil
+	}
+
+	var payload struct {
+		Issue *struct {
+			ID  string `json:"id"`
+			Key string `json:"key"`
+		} `json:"issue"` // Jira
+		SysID  string `json:"sys_id"` // ServiceNow
+		Number string `json:"number"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return fmt.Errorf("%w: invalid payload", ErrInvalidTicketIntegration)
+	}
+	id, key := payload.SysID, payload.Number
+	if payload.Issue != nil {
+		id, key = payload.Issue.ID, payload.Issue.Key
+	}
+	if id == "" && key == "" {
+		return fmt.Errorf("%w: payload does not identify an issue", ErrInvalidTicketIntegration)
+	}
+
+	var ticket model.AlertTicket
+	err := s.db.Where("integration_id = ? AND (external_id = ? OR external_key = ?)", integration.ID, id, key).First(&ticket).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	client, err := newTicketClient(s.http, &integration)
+	if err != nil {
+		return err
+	}
+	return s.syncTicket(ctx, client, &integration, &ticket)
+}
+
+// syncTicket records an issue's status and resolves its alert once the issue
+// is closed
+func (s *TicketingService) syncTicket(ctx context.Context, client ticketClient, integration *model.TicketIntegration, ticket *model.AlertTicket) error {
+	state, err := client.State(ctx, ticketReference(ticket))
+	now := time.Now()
+	ticket.LastSyncedAt = &now
+	if err != nil {
+		ticket.Error = err.Error()
+		s.db.Save(ticket)
+		return fmt.Errorf("%w: %v", ErrTicketingFailed, err)
+	}
+	closed := state.Closed && ticket.Status == model.AlertTicketOpen
+	ticket.ExternalStatus = state.Status
+	ticket.Error = ""
+	if state.Closed {
+		ticket.Status = model.AlertTicketResolved
+	}
+	if err := s.db.Save(ticket).Error; err != nil {
+		return err
+	}
+	if !closed || !integration.SyncStatus {
+		return nil
+	}
+
+	var alert model.Alert
+	err = s.db.Where("id = ? AND status IN ?", ticket.AlertID, []model.AlertStatus{model.AlertStatusFiring, model.AlertStatusSilenced}).
+		First(&alert).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.alerts.ResolveAlert(&alert); err != nil {
+		return err
+	}
+	s.logger.Info("resolved alert whose ticket was closed",
+		zap.String("alertId", alert.ID.String()),
+		zap.String("ticket", ticket.ExternalKey),
+		zap.String("status", state.Status),
+	)
+	return nil
+}
@@ -0,0 +1,312 @@
+// Package service provides the Jira and ServiceNow clients of ticketing integrations
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+const (
+	// ticketResponseChars bounds how much of an error response is kept
+	ticketResponseChars = 2000
+	// defaultServiceNowTable is the table incidents are opened in
+	defaultServiceNowTable = "incident"
+	// defaultServiceNowResolvedState is the incident state alerts resolve issues to
+	defaultServiceNowResolvedState = "6"
+	// defaultJiraTransition is the transition alerts resolve issues with
+	defaultJiraTransition = "Done"
+)
+
+// serviceNowStates names the states of ServiceNow incidents
+var serviceNowStates = map[string]string{
+	"1": "New",
+	"2": "In Progress",
+	"3": "On Hold",
+	"6": "Resolved",
+	"7": "Closed",
+	"8": "Canceled",
+}
+
+// ticketRef identifies an issue in its ticketing system
+type ticketRef struct {
+	ID  string // Jira issue ID, or ServiceNow sys_id
+	Key string // Jira issue key, or ServiceNow number
+	URL string // Where people open the issue
+}
+
+// ticketState is an issue's status, and whether it counts as closed
+type ticketState struct {
+	Status string
+	Closed bool
+}
+
+// ticketClient opens and updates the issues of one integration
+type ticketClient interface {
+	Check(ctx context.Context) error
+	Create(ctx context.Context, summary, description string, fields map[string]interface{}) (*ticketRef, error)
+	Comment(ctx context.Context, ref *ticketRef, text string) error
+	Resolve(ctx context.Context, ref *ticketRef, text string) error
+	State(ctx context.Context, ref *ticketRef) (*ticketState, error)
+}
+
+// newTicketClient returns the client of an integration's provider
+func newTicketClient(httpClient *http.Client, integration *model.TicketIntegration) (ticketClient, error) {
+	base := ticketAPI{
+		http:     httpClient,
+		baseURL:  strings.TrimRight(integration.BaseURL, "/"),
+		username: integration.Username,
+		token:    integration.Token,
+	}
+	switch integration.Provider {
+	case model.TicketProviderJira:
+		transition := integration.ResolveTransition
+		if transition == "" {
+			transition = defaultJiraTransition
+		}
+		return &jiraClient{api: base, project: integration.Project, issueType: integration.IssueType, transition: transition}, nil
+	case model.TicketProviderServiceNow:
+		table := integration.IssueType
+		if table == "" {
+			table = defaultServiceNowTable
+		}
+		state := integration.ResolveTransition
+		if state == "" {
+			state = defaultServiceNowResolvedState
+		}
+		return &serviceNowClient{api: base, table: table, group: integration.Project, resolvedState: state}, nil
+	default:
+		return nil, fmt.Errorf("unknown ticket provider %q", integration.Provider)
+	}
+}
+
+// ticketAPI sends authenticated JSON requests to a ticketing system
+type ticketAPI struct {
+	http     *http.Client
+	baseURL  string
+	username string
+	token    string
+}
+
+// do sends body as JSON and decodes a JSON response into out, when given
+func (a *ticketAPI) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "myops-ticketing/1.0")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if a.username != "" {
+		req.SetBasicAuth(a.username, a.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, ticketResponseChars))
+		return fmt.Errorf("%s %s responded with status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response to %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// jiraClient opens issues in a Jira project through the REST API v2, whose
+// descriptions and comments are plain text
+type jiraClient struct {
+	api        ticketAPI
+	project    string
+	issueType  string
+	transition string
+}
+
+type jiraStatus struct {
+	Name           string `json:"name"`
+	StatusCategory struct {
+		Key string `json:"key"`
+	} `json:"statusCategory"`
+}
+
+func (c *jiraClient) Check(ctx context.Context) error {
+	if err := c.api.do(ctx, http.MethodGet, "/rest/api/2/myself", nil, nil); err != nil {
+		return err
+	}
+	return c.api.do(ctx, http.MethodGet, "/rest/api/2/project/"+url.PathEscape(c.project), nil, nil)
+}
+
+func (c *jiraClient) Create(ctx context.Context, summary, description string, fields map[string]interface{}) (*ticketRef, error) {
+	issue := map[string]interface{}{}
+	for name, value := range fields {
+		issue[name] = value
+	}
+	issue["project"] = map[string]string{"key": c.project}
+	issue["issuetype"] = map[string]string{"name": c.issueType}
+	issue["summary"] = summary
+	issue["description"] = description
+
+	var created struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	if err := c.api.do(ctx, http.MethodPost, "/rest/api/2/issue", map[string]interface{}{"fields": issue}, &created); err != nil {
+		return nil, err
+	}
+	return &ticketRef{ID: created.ID, Key: created.Key, URL: c.api.baseURL + "/browse/" + created.Key}, nil
+}
+
+func (c *jiraClient) Comment(ctx context.Context, ref *ticketRef, text string) error {
+	return c.api.do(ctx, http.MethodPost, "/rest/api/2/issue/"+url.PathEscape(ref.ID)+"/comment", map[string]string{"body": text}, nil)
+}
+
+// Resolve comments on the issue and moves it with the configured transition,
+// or any transition into the done category when the issue's workflow has no
+// transition of that name
+func (c *jiraClient) Resolve(ctx context.Context, ref *ticketRef, text string) error {
+	if err := c.Comment(ctx, ref, text); err != nil {
+		return err
+	}
+	var available struct {
+		Transitions []struct {
+			ID   string     `json:"id"`
+			Name string     `json:"name"`
+			To   jiraStatus `json:"to"`
+		} `json:"transitions"`
+	}
+	path := "/rest/api/2/issue/" + url.PathEscape(ref.ID) + "/transitions"
+	if err := c.api.do(ctx, http.MethodGet, path, nil, &available); err != nil {
+		return err
+	}
+	transitionID := ""
+	for _, t := range available.Transitions {
+		if strings.EqualFold(t.Name, c.transition) {
+			transitionID = t.ID
+			break
+		}
+		if transitionID == "" && t.To.StatusCategory.Key == "done" {
+			transitionID = t.ID
+		}
+	}
+	if transitionID == "" {
+		return fmt.Errorf("issue %s has no %q transition", ref.Key, c.transition)
+	}
+	return c.api.do(ctx, http.MethodPost, path, map[string]interface{}{"transition": map[string]string{"id": transitionID}}, nil)
+}
+
+func (c *jiraClient) State(ctx context.Context, ref *ticketRef) (*ticketState, error) {
+	var issue struct {
+		Fields struct {
+			Status jiraStatus `json:"status"`
+		} `json:"fields"`
+	}
+	if err := c.api.do(ctx, http.MethodGet, "/rest/api/2/issue/"+url.PathEscape(ref.ID)+"?fields=status", nil, &issue); err != nil {
+		return nil, err
+	}
+	status := issue.Fields.Status
+	return &ticketState{Status: status.Name, Closed: status.StatusCategory.Key == "done"}, nil
+}
+
+// serviceNowClient opens records in a ServiceNow table, incidents by default,
+// through the Table API. Work notes carry the alert's updates.
+type serviceNowClient struct {
+	api           ticketAPI
+	table         string
+	group         string
+	resolvedState string
+}
+
+type serviceNowRecord struct {
+	SysID  string `json:"sys_id"`
+	Number string `json:"number"`
+	State  string `json:"state"`
+}
+
+func (c *serviceNowClient) path(sysID string) string {
+	path := "/api/now/table/" + url.PathEscape(c.table)
+	if sysID != "" {
+		path += "/" + url.PathEscape(sysID)
+	}
+	return path
+}
+
+func (c *serviceNowClient) Check(ctx context.Context) error {
+	return c.api.do(ctx, http.MethodGet, c.path("")+"?sysparm_limit=1&sysparm_fields=sys_id", nil, nil)
+}
+
+func (c *serviceNowClient) Create(ctx context.Context, summary, description string, fields map[string]interface{}) (*ticketRef, error) {
+	record := map[string]interface{}{}
+	for name, value := range fields {
+		record[name] = value
+	}
+	record["short_description"] = summary
+	record["description"] = description
+	if c.group != "" {
+		record["assignment_group"] = c.group
+	}
+
+	var created struct {
+		Result serviceNowRecord `json:"result"`
+	}
+	if err := c.api.do(ctx, http.MethodPost, c.path(""), record, &created); err != nil {
+		return nil, err
+	}
+	link := c.api.baseURL + "/nav_to.do?uri=" + url.QueryEscape(c.table+".do?sys_id="+created.Result.SysID)
+	return &ticketRef{ID: created.Result.SysID, Key: created.Result.Number, URL: link}, nil
+}
+
+func (c *serviceNowClient) Comment(ctx context.Context, ref *ticketRef, text string) error {
+	return c.api.do(ctx, http.MethodPatch, c.path(ref.ID), map[string]string{"work_notes": text}, nil)
+}
+
+func (c *serviceNowClient) Resolve(ctx context.Context, ref *ticketRef, text string) error {
+	return c.api.do(ctx, http.MethodPatch, c.path(ref.ID), map[string]string{
+		"state":       c.resolvedState,
+		"close_notes": text,
+		"work_notes":  text,
+	}, nil)
+}
+
+// State reports records at or past the resolved state, resolved, closed or
+// canceled, as closed
+func (c *serviceNowClient) State(ctx context.Context, ref *ticketRef) (*ticketState, error) {
+	var record struct {
+		Result serviceNowRecord `json:"result"`
+	}
+	if err := c.api.do(ctx, http.MethodGet, c.path(ref.ID)+"?sysparm_fields=sys_id,number,state", nil, &record); err != nil {
+		return nil, err
+	}
+	status := record.Result.State
+	if name, ok := serviceNowStates[status]; ok {
+		status = name
+	}
+	state, _ := strconv.Atoi(record.Result.State)
+	resolved, _ := strconv.Atoi(c.resolvedState)
+	return &ticketState{Status: status, Closed: resolved > 0 && state >= resolved}, nil
+}
@@ -0,0 +1,847 @@
+// Package service provides the topology map of clusters and managed hosts
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// topologyRefreshInterval is how often Run rebuilds the map and publishes
+	// what changed; snapshots older than twice this are rebuilt when requested
+	topologyRefreshInterval = time.Minute
+	// topologyBuildTimeout bounds reading one cluster
+	topologyBuildTimeout = 20 * time.Second
+	// maxTopologyNodes bounds the nodes returned in one graph
+	maxTopologyNodes = 5000
+)
+
+// topologySnapshot is one source of the map, a cluster or the managed hosts, as
+// built with full access. Views for users are cut from it.
+type topologySnapshot struct {
+	source  model.TopologySource
+	cluster *model.K8sCluster // nil for the hosts snapshot; only ID, UserID and Name are set
+	nodes   map[string]model.TopologyNode
+	edges   map[model.TopologyEdge]bool
+}
+
+// TopologyService builds the map of clusters, their nodes, pods and services and
+// the managed hosts, with the health of each from its status and open alerts
+// and anomalies. It keeps the last build of each part and publishes the changes
+// between builds to the users who can see them.
+type TopologyService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	fanout *ClusterFanoutService
+	events *EventBus
+
+	mu        sync.Mutex
+	snapshots map[uuid.UUID]*topologySnapshot // by cluster; uuid.Nil holds the hosts
+}
+
+// NewTopologyService creates a new topology service. Cluster access is decided
+// as for fan-out queries.
+func NewTopologyService(db *gorm.DB, logger *zap.Logger, fanout *ClusterFanoutService) *TopologyService {
+	return &TopologyService{
+		db:        db,
+		logger:    logger,
+		fanout:    fanout,
+		snapshots: make(map[uuid.UUID]*topologySnapshot),
+	}
+}
+
+// SetEventBus sets the bus map changes are published on
+func (s *TopologyService) SetEventBus(events *EventBus) {
+	s.events = events
+}
+
+// Run rebuilds the map every topologyRefreshInterval until ctx is cancelled
+func (s *TopologyService) Run(ctx context.Context) {
+	ticker := time.NewTicker(topologyRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.RefreshAll(ctx)
+		}
+	}
+}
+
+// RefreshAll rebuilds every cluster and the managed hosts, and removes the
+// clusters that were deleted
+func (s *TopologyService) RefreshAll(ctx context.Context) {
+	var clusters []model.K8sCluster
+	if err := s.db.Find(&clusters).Error; err != nil {
+		s.logger.Error("failed to list clusters for the topology map", zap.Error(err))
+		return
+	}
+	hosts, err := s.loadHosts()
+	if err != nil {
+		s.logger.Error("failed to list hosts for the topology map", zap.Error(err))
+		return
+	}
+
+	s.refreshClusters(ctx, clusters, hosts)
+	s.refreshHosts(hosts)
+
+	current := make(map[uuid.UUID]bool, len(clusters))
+	for _, cluster := range clusters {
+		current[cluster.ID] = true
+	}
+	s.mu.Lock()
+	var removed []*topologySnapshot
+	for id, snapshot := range s.snapshots {
+		if id != uuid.Nil && !current[id] {
+			removed = append(removed, snapshot)
+			delete(s.snapshots, id)
+		}
+	}
+	s.mu.Unlock()
+	for _, snapshot := range removed {
+		s.publish(snapshot, nil)
+	}
+}
+
+// Graph returns the map as the user may see it. Clusters are those requested, or
+// every cluster the user can see; parts not built recently are built first.
+func (s *TopologyService) Graph(ctx context.Context, userID uuid.UUID, filter *model.TopologyFilter) (*model.TopologyGraph, error) {
+	targets, err := s.fanout.targets(userID, filter.ClusterIDs)
+	if err != nil {
+		return nil, err
+	}
+	hosts := filter.Hosts && model.UserHasPermission(s.db, userID, "hosts", "list", nil, "").Allowed
+
+	if err := s.ensure(ctx, targets, hosts); err != nil {
+		return nil, err
+	}
+
+	graph := &model.TopologyGraph{Nodes: []model.TopologyNode{}, Edges: []model.TopologyEdge{}, Sources: []model.TopologySource{}}
+	nodes := make(map[string]model.TopologyNode)
+	edges := make(map[model.TopologyEdge]bool)
+	add := func(snapshot *topologySnapshot, visible map[string]bool) {
+		viewNodes, viewEdges := snapshot.view(visible, hosts)
+		for id, node := range viewNodes {
+			nodes[id] = node
+		}
+		for edge := range viewEdges {
+			edges[edge] = true
+		}
+		graph.Sources = append(graph.Sources, snapshot.source)
+	}
+	for i := range targets {
+		target := &targets[i]
+		if target.err != nil {
+			id := target.cluster.ID
+			graph.Sources = append(graph.Sources, model.TopologySource{ClusterID: &id, Error: target.err.Error()})
+			continue
+		}
+		if snapshot := s.snapshot(target.cluster.ID); snapshot != nil {
+			add(snapshot, target.visible)
+		}
+	}
+	if hosts {
+		if snapshot := s.snapshot(uuid.Nil); snapshot != nil {
+			add(snapshot, nil)
+		}
+	}
+
+	kept := filterTopology(nodes, edges, filter)
+	sort.Slice(kept, func(i, j int) bool {
+		a, b := kept[i], kept[j]
+		if a.Kind != b.Kind {
+			return topologyKindOrder(a.Kind) < topologyKindOrder(b.Kind)
+		}
+		return a.ID < b.ID
+	})
+	if len(kept) > maxTopologyNodes {
+		kept, graph.Truncated = kept[:maxTopologyNodes], true
+	}
+	ids := make(map[string]bool, len(kept))
+	for _, node := range kept {
+		ids[node.ID] = true
+	}
+	graph.Nodes = kept
+	for edge := range edges {
+		if ids[edge.Source] && ids[edge.Target] {
+			graph.Edges = append(graph.Edges, edge)
+		}
+	}
+	sortTopologyEdges(graph.Edges)
+	return graph, nil
+}
+
+// ensure builds the parts of the map a graph needs that were not built recently
+func (s *TopologyService) ensure(ctx context.Context, targets []fanoutTarget, hosts bool) error {
+	staleBefore := time.Now().Add(-2 * topologyRefreshInterval)
+	fresh := func(id uuid.UUID) bool {
+		snapshot := s.snapshot(id)
+		return snapshot != nil && snapshot.source.BuiltAt.After(staleBefore)
+	}
+
+	var stale []model.K8sCluster
+	for _, target := range targets {
+		if target.err == nil && !fresh(target.cluster.ID) {
+			stale = append(stale, target.cluster)
+		}
+	}
+	staleHosts := hosts && !fresh(uuid.Nil)
+	if len(stale) == 0 && !staleHosts {
+		return nil
+	}
+
+	all, err := s.loadHosts()
+	if err != nil {
+		return err
+	}
+	s.refreshClusters(ctx, stale, all)
+	if staleHosts {
+		s.refreshHosts(all)
+	}
+	return nil
+}
+
+func (s *TopologyService) snapshot(id uuid.UUID) *topologySnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshots[id]
+}
+
+// refreshClusters rebuilds clusters in parallel
+func (s *TopologyService) refreshClusters(ctx context.Context, clusters []model.K8sCluster, hosts []model.Host) {
+	slots := make(chan struct{}, fanoutConcurrency)
+	var wg sync.WaitGroup
+	for i := range clusters {
+		wg.Add(1)
+		go func(cluster *model.K8sCluster) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			s.store(s.buildCluster(ctx, cluster, hosts))
+		}(&clusters[i])
+	}
+	wg.Wait()
+}
+
+func (s *TopologyService) refreshHosts(hosts []model.Host) {
+	snapshot, err := s.buildHosts(hosts)
+	if err != nil {
+		s.logger.Error("failed to build the hosts of the topology map", zap.Error(err))
+		return
+	}
+	s.store(snapshot)
+}
+
+// loadHosts lists the hosts that were let in and not retired
+func (s *TopologyService) loadHosts() ([]model.Host, error) {
+	var hosts []model.Host
+	err := s.db.Select("id, hostname, ip_address, status, os_type, tags").
+		Where("status NOT IN ? AND lifecycle <> ?", []model.HostStatus{model.HostStatusPending, model.HostStatusRejected}, model.HostLifecycleRetired).
+		Order("hostname").Find(&hosts).Error
+	return hosts, err
+}
+
+// store replaces a snapshot and publishes what changed. A build that failed
+// keeps the last known resources so a blip does not empty the map.
+func (s *TopologyService) store(next *topologySnapshot) {
+	id := uuid.Nil
+	if next.cluster != nil {
+		id = next.cluster.ID
+	}
+
+	s.mu.Lock()
+	prev := s.snapshots[id]
+	if prev != nil && next.source.Error != "" {
+		clusterNode := next.nodes[next.clusterNodeID()]
+		next.nodes, next.edges = make(map[string]model.TopologyNode, len(prev.nodes)), prev.edges
+		for nodeID, node := range prev.nodes {
+			next.nodes[nodeID] = node
+		}
+		next.nodes[clusterNode.ID] = clusterNode
+	}
+	changed := prev == nil || !reflect.DeepEqual(prev.nodes, next.nodes) || !reflect.DeepEqual(prev.edges, next.edges)
+	switch {
+	case prev == nil:
+		// Revisions start from the clock so a restarted gateway does not reuse
+		// the revisions clients hold
+		next.source.Revision = time.Now().UnixMilli()
+	case changed:
+		next.source.Revision = prev.source.Revision + 1
+	default:
+		next.source.Revision = prev.source.Revision
+	}
+	s.snapshots[id] = next
+	s.mu.Unlock()
+
+	if prev != nil && changed {
+		s.publish(prev, next)
+	}
+}
+
+// publish sends each user who can see the part of the map the change they see.
+// next is nil when a cluster was removed.
+func (s *TopologyService) publish(prev, next *topologySnapshot) {
+	if s.events == nil {
+		return
+	}
+	cluster := prev.cluster
+	users, err := s.audience(cluster)
+	if err != nil {
+		s.logger.Error("failed to find the users of a topology change", zap.Error(err))
+		return
+	}
+
+	attrs := map[string]string{}
+	if cluster != nil {
+		attrs["clusterId"] = cluster.ID.String()
+	}
+	for _, userID := range users {
+		hosts := model.UserHasPermission(s.db, userID, "hosts", "list", nil, "").Allowed
+		var visible map[string]bool
+		if cluster != nil {
+			target, err := s.fanout.authorize(userID, *cluster)
+			if err != nil || target.err != nil {
+				continue
+			}
+			visible = target.visible
+		} else if !hosts {
+			continue
+		}
+
+		delta := diffTopology(prev, next, visible, hosts)
+		if delta == nil {
+			continue
+		}
+		s.events.Publish(userID, model.EventTopologyChanged, attrs, delta)
+	}
+}
+
+// audience lists the users who may see part of a cluster, or every user with a
+// role that is not bound to a resource for the hosts
+func (s *TopologyService) audience(cluster *model.K8sCluster) ([]uuid.UUID, error) {
+	query := s.db.Model(&model.UserRole{}).Where("expires_at IS NULL OR expires_at > ?", time.Now())
+	if cluster != nil {
+		query = query.Where("resource_id IS NULL OR (resource_type = ? AND resource_id = ?)", "cluster", cluster.ID)
+	} else {
+		query = query.Where("resource_id IS NULL")
+	}
+	var users []uuid.UUID
+	if err := query.Distinct().Pluck("user_id", &users).Error; err != nil {
+		return nil, err
+	}
+	if cluster != nil && !containsUUID(users, cluster.UserID) {
+		users = append(users, cluster.UserID)
+	}
+	return users, nil
+}
+
+// buildCluster reads a cluster's nodes, pods and services. Failures are recorded
+// on the snapshot rather than returned.
+func (s *TopologyService) buildCluster(ctx context.Context, cluster *model.K8sCluster, hosts []model.Host) *topologySnapshot {
+	clusterID := cluster.ID
+	snapshot := &topologySnapshot{
+		source:  model.TopologySource{ClusterID: &clusterID, ClusterName: cluster.Name, BuiltAt: time.Now()},
+		cluster: &model.K8sCluster{ID: cluster.ID, UserID: cluster.UserID, Name: cluster.Name},
+		nodes:   make(map[string]model.TopologyNode),
+		edges:   make(map[model.TopologyEdge]bool),
+	}
+	clusterNode := model.TopologyNode{
+		ID:        snapshot.clusterNodeID(),
+		Kind:      model.TopologyKindCluster,
+		Name:      cluster.Name,
+		ClusterID: &clusterID,
+		Status:    string(cluster.Status),
+		Health:    model.TopologyHealthHealthy,
+	}
+	fail := func(err error) *topologySnapshot {
+		snapshot.source.Error = err.Error()
+		clusterNode.Health = model.TopologyHealthCritical
+		if cluster.Status == model.ClusterStatusDisabled {
+			clusterNode.Health = model.TopologyHealthUnknown
+		}
+		snapshot.nodes[clusterNode.ID] = clusterNode
+		s.enrichCluster(snapshot)
+		return snapshot
+	}
+	if cluster.Status == model.ClusterStatusDisabled {
+		return fail(fmt.Errorf("cluster is disabled"))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, topologyBuildTimeout)
+	defer cancel()
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return fail(err)
+	}
+	defer client.Close()
+
+	nodes, err := client.GetNodes(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	pods, err := client.GetPods(ctx, "")
+	if err != nil {
+		return fail(err)
+	}
+	services, err := client.GetServices(ctx, "")
+	if err != nil {
+		return fail(err)
+	}
+	snapshot.nodes[clusterNode.ID] = clusterNode
+
+	// Managed hosts are matched to the nodes they are by address or name
+	byAddress := make(map[string]*model.Host, len(hosts))
+	byName := make(map[string]*model.Host, len(hosts))
+	for i := range hosts {
+		byAddress[hosts[i].IPAddress] = &hosts[i]
+		byName[strings.ToLower(hosts[i].Hostname)] = &hosts[i]
+	}
+
+	for _, node := range nodes {
+		n := model.TopologyNode{
+			ID:        topologyID(model.TopologyKindNode, clusterID, node.Name),
+			Kind:      model.TopologyKindNode,
+			Name:      node.Name,
+			ClusterID: &clusterID,
+			Status:    node.Status,
+			Health:    model.TopologyHealthHealthy,
+			Attributes: map[string]string{
+				"internalIp": node.InternalIP,
+				"roles":      node.Roles,
+				"version":    node.Version,
+			},
+		}
+		if node.Status != "Ready" {
+			n.Health = model.TopologyHealthCritical
+		}
+		host := byAddress[node.InternalIP]
+		if host == nil {
+			host = byName[strings.ToLower(node.Name)]
+		}
+		if host != nil {
+			hostID := host.ID
+			n.HostID = &hostID
+			snapshot.edges[model.TopologyEdge{Source: hostTopologyID(host.ID), Target: n.ID, Kind: model.TopologyEdgeMachine}] = true
+		}
+		snapshot.nodes[n.ID] = n
+		snapshot.edges[model.TopologyEdge{Source: clusterNode.ID, Target: n.ID, Kind: model.TopologyEdgeContains}] = true
+	}
+
+	for _, pod := range pods {
+		p := model.TopologyNode{
+			ID:        topologyID(model.TopologyKindPod, clusterID, pod.Namespace+"/"+pod.Name),
+			Kind:      model.TopologyKindPod,
+			Name:      pod.Name,
+			ClusterID: &clusterID,
+			Namespace: pod.Namespace,
+			Status:    pod.Phase,
+			Health:    podHealth(&pod),
+			Attributes: map[string]string{
+				"node":     pod.NodeName,
+				"restarts": fmt.Sprint(pod.RestartCount),
+			},
+		}
+		if pod.OwnerName != "" {
+			p.Attributes["owner"] = pod.OwnerType + "/" + pod.OwnerName
+		}
+		snapshot.nodes[p.ID] = p
+		if pod.NodeName != "" {
+			snapshot.edges[model.TopologyEdge{Source: topologyID(model.TopologyKindNode, clusterID, pod.NodeName), Target: p.ID, Kind: model.TopologyEdgeRuns}] = true
+		}
+	}
+
+	for _, svc := range services {
+		n := model.TopologyNode{
+			ID:        topologyID(model.TopologyKindService, clusterID, svc.Namespace+"/"+svc.Name),
+			Kind:      model.TopologyKindService,
+			Name:      svc.Name,
+			ClusterID: &clusterID,
+			Namespace: svc.Namespace,
+			Status:    svc.Type,
+			Health:    model.TopologyHealthHealthy,
+			Attributes: map[string]string{
+				"clusterIp": svc.ClusterIP,
+			},
+		}
+		selected := 0
+		for _, pod := range pods {
+			if pod.Namespace == svc.Namespace && selectsPod(svc.Selector, pod.Labels) {
+				selected++
+				snapshot.edges[model.TopologyEdge{Source: n.ID, Target: topologyID(model.TopologyKindPod, clusterID, pod.Namespace+"/"+pod.Name), Kind: model.TopologyEdgeSelects}] = true
+			}
+		}
+		// Services without a selector are backed by endpoints managed elsewhere
+		if len(svc.Selector) > 0 && selected == 0 {
+			n.Health = model.TopologyHealthWarning
+			n.Attributes["reason"] = "selects no pods"
+		}
+		snapshot.nodes[n.ID] = n
+	}
+
+	s.enrichCluster(snapshot)
+	return snapshot
+}
+
+// buildHosts builds the managed hosts part of the map
+func (s *TopologyService) buildHosts(hosts []model.Host) (*topologySnapshot, error) {
+	snapshot := &topologySnapshot{
+		source: model.TopologySource{BuiltAt: time.Now()},
+		nodes:  make(map[string]model.TopologyNode, len(hosts)),
+		edges:  make(map[model.TopologyEdge]bool),
+	}
+	for _, host := range hosts {
+		hostID := host.ID
+		n := model.TopologyNode{
+			ID:     hostTopologyID(host.ID),
+			Kind:   model.TopologyKindHost,
+			Name:   host.Hostname,
+			HostID: &hostID,
+			Status: string(host.Status),
+			Health: hostHealth(host.Status),
+			Attributes: map[string]string{
+				"ipAddress": host.IPAddress,
+				"osType":    host.OSType,
+			},
+		}
+		if len(host.Tags) > 0 {
+			n.Attributes["tags"] = strings.Join(host.Tags, ",")
+		}
+		snapshot.nodes[n.ID] = n
+	}
+
+	var alerts []model.Alert
+	if err := s.db.Select("host_id, severity").Where("status = ? AND host_id IS NOT NULL", model.AlertStatusFiring).Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	for _, alert := range alerts {
+		snapshot.flag(hostTopologyID(*alert.HostID), string(alert.Severity), true)
+	}
+	var anomalies []model.AnomalyEvent
+	if err := s.db.Select("host_id, severity").Where("status IN ? AND host_id IS NOT NULL", openAnomalyStatuses).Find(&anomalies).Error; err != nil {
+		return nil, err
+	}
+	for _, anomaly := range anomalies {
+		snapshot.flag(hostTopologyID(*anomaly.HostID), anomaly.Severity, false)
+	}
+	return snapshot, nil
+}
+
+// openAnomalyStatuses are the anomaly statuses that count against a node's health
+var openAnomalyStatuses = []string{model.AnomalyStatusActive, model.AnomalyStatusAcknowledged}
+
+// enrichCluster counts the cluster's firing alerts and open anomalies against the
+// resources their labels name, or against the cluster
+func (s *TopologyService) enrichCluster(snapshot *topologySnapshot) {
+	clusterID := snapshot.cluster.ID
+
+	var alerts []model.Alert
+	if err := s.db.Select("severity, labels").Where("status = ? AND cluster_id = ?", model.AlertStatusFiring, clusterID).Find(&alerts).Error; err != nil {
+		s.logger.Warn("failed to load alerts for the topology map", zap.String("clusterId", clusterID.String()), zap.Error(err))
+	}
+	for _, alert := range alerts {
+		snapshot.flag(snapshot.labelTarget(alert.Labels), string(alert.Severity), true)
+	}
+
+	var anomalies []model.AnomalyEvent
+	if err := s.db.Select("severity, labels").Where("status IN ? AND cluster_id = ?", openAnomalyStatuses, clusterID).Find(&anomalies).Error; err != nil {
+		s.logger.Warn("failed to load anomalies for the topology map", zap.String("clusterId", clusterID.String()), zap.Error(err))
+	}
+	for _, anomaly := range anomalies {
+		snapshot.flag(snapshot.labelTarget(anomaly.Labels), anomaly.Severity, false)
+	}
+}
+
+// labelTarget finds the node an alert or anomaly is about from its labels, in the
+// Prometheus and kube-state-metrics naming, falling back to the cluster
+func (snapshot *topologySnapshot) labelTarget(rawLabels string) string {
+	var labels map[string]string
+	if rawLabels != "" {
+		_ = json.Unmarshal([]byte(rawLabels), &labels)
+	}
+	clusterID := snapshot.cluster.ID
+	namespace := labels["namespace"]
+	candidates := []string{}
+	if namespace != "" && labels["pod"] != "" {
+		candidates = append(candidates, topologyID(model.TopologyKindPod, clusterID, namespace+"/"+labels["pod"]))
+	}
+	if namespace != "" && labels["service"] != "" {
+		candidates = append(candidates, topologyID(model.TopologyKindService, clusterID, namespace+"/"+labels["service"]))
+	}
+	for _, key := range []string{"node", "kubernetes_node"} {
+		if labels[key] != "" {
+			candidates = append(candidates, topologyID(model.TopologyKindNode, clusterID, labels[key]))
+		}
+	}
+	for _, id := range candidates {
+		if _, ok := snapshot.nodes[id]; ok {
+			return id
+		}
+	}
+	return snapshot.clusterNodeID()
+}
+
+// flag counts an alert or anomaly of the given severity against a node and
+// worsens its health to match
+func (snapshot *topologySnapshot) flag(id, severity string, alert bool) {
+	node, ok := snapshot.nodes[id]
+	if !ok {
+		return
+	}
+	if alert {
+		node.Alerts++
+	} else {
+		node.Anomalies++
+	}
+	health := model.TopologyHealthWarning
+	if severity == string(model.AlertSeverityCritical) {
+		health = model.TopologyHealthCritical
+	}
+	if health.Rank() > node.Health.Rank() {
+		node.Health = health
+	}
+	snapshot.nodes[id] = node
+}
+
+func (snapshot *topologySnapshot) clusterNodeID() string {
+	return topologyID(model.TopologyKindCluster, snapshot.cluster.ID, "")
+}
+
+// view cuts the part of the snapshot a user may see. visible holds the namespaces
+// of a user bound to some namespaces only, who sees neither nodes nor hosts and
+// has pods hung from the cluster instead; hosts says whether managed hosts are
+// shown. A nil snapshot has an empty view.
+func (snapshot *topologySnapshot) view(visible map[string]bool, hosts bool) (map[string]model.TopologyNode, map[model.TopologyEdge]bool) {
+	nodes := make(map[string]model.TopologyNode)
+	edges := make(map[model.TopologyEdge]bool)
+	if snapshot == nil {
+		return nodes, edges
+	}
+
+	for id, node := range snapshot.nodes {
+		if visible != nil {
+			if node.Kind == model.TopologyKindNode {
+				continue
+			}
+			if node.Namespace != "" && !visible[node.Namespace] {
+				continue
+			}
+		}
+		nodes[id] = node
+	}
+	for edge := range snapshot.edges {
+		_, source := nodes[edge.Source]
+		_, target := nodes[edge.Target]
+		// Host endpoints live in the hosts snapshot
+		if edge.Kind == model.TopologyEdgeMachine {
+			source = hosts
+		}
+		if source && target {
+			edges[edge] = true
+		}
+	}
+	if visible != nil && snapshot.cluster != nil {
+		clusterNodeID := snapshot.clusterNodeID()
+		for id, node := range nodes {
+			if node.Kind == model.TopologyKindPod {
+				edges[model.TopologyEdge{Source: clusterNodeID, Target: id, Kind: model.TopologyEdgeContains}] = true
+			}
+		}
+	}
+	return nodes, edges
+}
+
+// diffTopology returns the change between two snapshots of a source as one user
+// sees it, or nil when the user sees no change
+func diffTopology(prev, next *topologySnapshot, visible map[string]bool, hosts bool) *model.TopologyDelta {
+	oldNodes, oldEdges := prev.view(visible, hosts)
+	newNodes, newEdges := next.view(visible, hosts)
+
+	delta := &model.TopologyDelta{ClusterID: prev.source.ClusterID, PreviousRevision: prev.source.Revision, Revision: prev.source.Revision}
+	if next != nil {
+		delta.Revision = next.source.Revision
+	}
+	for id, node := range newNodes {
+		if old, ok := oldNodes[id]; !ok || !reflect.DeepEqual(old, node) {
+			delta.Upserted = append(delta.Upserted, node)
+		}
+	}
+	for id := range oldNodes {
+		if _, ok := newNodes[id]; !ok {
+			delta.Removed = append(delta.Removed, id)
+		}
+	}
+	for edge := range newEdges {
+		if !oldEdges[edge] {
+			delta.AddedEdges = append(delta.AddedEdges, edge)
+		}
+	}
+	for edge := range oldEdges {
+		if !newEdges[edge] {
+			delta.RemovedEdges = append(delta.RemovedEdges, edge)
+		}
+	}
+	if len(delta.Upserted)+len(delta.Removed)+len(delta.AddedEdges)+len(delta.RemovedEdges) == 0 {
+		return nil
+	}
+
+	sort.Slice(delta.Upserted, func(i, j int) bool { return delta.Upserted[i].ID < delta.Upserted[j].ID })
+	sort.Strings(delta.Removed)
+	sortTopologyEdges(delta.AddedEdges)
+	sortTopologyEdges(delta.RemovedEdges)
+	return delta
+}
+
+// filterTopology applies a graph filter. With a namespace, nodes and hosts are
+// kept only when they run a pod of the namespace.
+func filterTopology(nodes map[string]model.TopologyNode, edges map[model.TopologyEdge]bool, filter *model.TopologyFilter) []model.TopologyNode {
+	kinds := make(map[model.TopologyKind]bool, len(filter.Kinds))
+	for _, kind := range filter.Kinds {
+		kinds[kind] = true
+	}
+	match := func(node model.TopologyNode) bool {
+		if node.Kind == model.TopologyKindCluster {
+			return true
+		}
+		if len(kinds) > 0 && !kinds[node.Kind] {
+			return false
+		}
+		return node.Health.Rank() >= filter.MinHealth.Rank()
+	}
+
+	keep := make(map[string]bool, len(nodes))
+	for id, node := range nodes {
+		if (filter.Namespace == "" || node.Namespace == filter.Namespace || node.Kind == model.TopologyKindCluster) && match(node) {
+			keep[id] = true
+		}
+	}
+	if filter.Namespace != "" {
+		// Nodes running a kept pod, then the hosts that are those nodes
+		for _, kind := range []string{model.TopologyEdgeRuns, model.TopologyEdgeMachine} {
+			for edge := range edges {
+				if edge.Kind != kind || !keep[edge.Target] {
+					continue
+				}
+				if node, ok := nodes[edge.Source]; ok && match(node) {
+					keep[edge.Source] = true
+				}
+			}
+		}
+	}
+
+	kept := make([]model.TopologyNode, 0, len(keep))
+	for id := range keep {
+		kept = append(kept, nodes[id])
+	}
+	return kept
+}
+
+// topologyID is the stable ID of a cluster resource on the map
+func topologyID(kind model.TopologyKind, clusterID uuid.UUID, name string) string {
+	if name == "" {
+		return string(kind) + ":" + clusterID.String()
+	}
+	return string(kind) + ":" + clusterID.String() + ":" + name
+}
+
+func hostTopologyID(hostID uuid.UUID) string {
+	return string(model.TopologyKindHost) + ":" + hostID.String()
+}
+
+// topologyKindOrder orders graph nodes from the cluster down
+func topologyKindOrder(kind model.TopologyKind) int {
+	switch kind {
+	case model.TopologyKindCluster:
+		return 0
+	case model.TopologyKindHost:
+		return 1
+	case model.TopologyKindNode:
+		return 2
+	case model.TopologyKindService:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func sortTopologyEdges(edges []model.TopologyEdge) {
+	sort.Slice(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.Kind < b.Kind
+	})
+}
+
+// podHealth judges a pod by its phase and readiness
+func podHealth(pod *k8s.PodInfo) model.TopologyHealth {
+	switch pod.Phase {
+	case "Running":
+		if pod.Ready {
+			return model.TopologyHealthHealthy
+		}
+		return model.TopologyHealthWarning
+	case "Succeeded":
+		return model.TopologyHealthHealthy
+	case "Pending":
+		return model.TopologyHealthWarning
+	case "Failed":
+		return model.TopologyHealthCritical
+	default:
+		return model.TopologyHealthUnknown
+	}
+}
+
+// hostHealth judges a host by its heartbeat status
+func hostHealth(status model.HostStatus) model.TopologyHealth {
+	switch status {
+	case model.HostStatusOnline, model.HostStatusApproved:
+		return model.TopologyHealthHealthy
+	case model.HostStatusDegraded:
+		return model.TopologyHealthWarning
+	case model.HostStatusOffline:
+		return model.TopologyHealthCritical
+	default:
+		return model.TopologyHealthUnknown
+	}
+}
+
+// selectsPod reports whether a service selector matches a pod's labels. An empty
+// selector selects nothing.
+func selectsPod(selector, labels map[string]string) bool {
+	if len(selector) == 0 {
+		return false
+	}
+	for key, value := range selector {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func containsUUID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+// Package service provides business logic for distributed tracing backends
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// Trace search limits
+const (
+	DefaultTraceSearchLimit = 20
+	MaxTraceSearchLimit     = 100
+	defaultTraceLookback    = time.Hour
+)
+
+// Anomaly windows extend before the detection time, when the cause is most likely
+// to have started, and a little after it
+const (
+	anomalyWindowBefore = 15 * time.Minute
+	anomalyWindowAfter  = 5 * time.Minute
+)
+
+// anomalyServiceLabels are the metric labels that identify a service, most specific first
+var anomalyServiceLabels = []string{"service.name", "service_name", "service", "app_kubernetes_io_name", "app", "job"}
+
+// TraceService queries tracing backends and links anomalies to traces
+type TraceService struct {
+	db *gorm.DB
+}
+
+// NewTraceService creates a new trace service
+func NewTraceService(db *gorm.DB) *TraceService {
+	return &TraceService{db: db}
+}
+
+// Test checks that a data source is reachable and records the result
+func (s *TraceService) Test(ctx context.Context, ds *model.TraceDataSource) error {
+	backend, err := NewTraceBackend(ds)
+	if err == nil {
+		err = backend.Ping(ctx)
+	}
+
+	updates := map[string]interface{}{
+		"last_test_at":     time.Now(),
+		"last_test_status": "success",
+		"last_test_error":  "",
+	}
+	if err != nil {
+		updates["last_test_status"] = "failed"
+		updates["last_test_error"] = err.Error()
+	}
+	s.db.Model(ds).Updates(updates)
+	return err
+}
+
+// Search finds traces, defaulting to the last hour and DefaultTraceSearchLimit results
+func (s *TraceService) Search(ctx context.Context, ds *model.TraceDataSource, query model.TraceSearchQuery) ([]model.TraceSummary, error) {
+	if query.End.IsZero() {
+		query.End = time.Now()
+	}
+	if query.Start.IsZero() {
+		query.Start = query.End.Add(-defaultTraceLookback)
+	}
+	if !query.Start.Before(query.End) {
+		return nil, fmt.Errorf("start must be before end")
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultTraceSearchLimit
+	}
+	if query.Limit > MaxTraceSearchLimit {
+		query.Limit = MaxTraceSearchLimit
+	}
+
+	backend, err := NewTraceBackend(ds)
+	if err != nil {
+		return nil, err
+	}
+	traces, err := backend.Search(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(traces, func(i, j int) bool {
+		return traces[i].StartTime.After(traces[j].StartTime)
+	})
+	return traces, nil
+}
+
+// GetTrace fetches a trace by its hex ID
+func (s *TraceService) GetTrace(ctx context.Context, ds *model.TraceDataSource, traceID string) (*model.Trace, error) {
+	if !traceIDPattern.MatchString(traceID) {
+		return nil, fmt.Errorf("invalid trace ID: %s", traceID)
+	}
+	backend, err := NewTraceBackend(ds)
+	if err != nil {
+		return nil, err
+	}
+	return backend.GetTrace(ctx, traceID)
+}
+
+// AnomalyCandidates finds traces within the anomaly's window that may explain it.
+// Traces with errors rank first, then the slowest. service overrides the service
+// derived from the anomaly's labels.
+func (s *TraceService) AnomalyCandidates(ctx context.Context, ds *model.TraceDataSource, event *model.AnomalyEvent, service string, limit int) (*model.AnomalyTraceCandidates, error) {
+	if service == "" {
+		service = AnomalyService(event)
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	start, end := AnomalyWindow(event)
+
+	backend, err := NewTraceBackend(ds)
+	if err != nil {
+		return nil, err
+	}
+	// Search wider than the result size so ranking has slow and failing traces to choose from
+	traces, err := backend.Search(ctx, &model.TraceSearchQuery{
+		Service: service,
+		Start:   start,
+		End:     end,
+		Limit:   MaxTraceSearchLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Search results from Tempo carry no span details; fetch them for the slowest
+	// traces so errors can be ranked
+	sort.SliceStable(traces, func(i, j int) bool { return traces[i].DurationMs > traces[j].DurationMs })
+	for i := range traces {
+		if i >= limit*2 {
+			break
+		}
+		if traces[i].SpanCount > 0 {
+			continue
+		}
+		if trace, err := backend.GetTrace(ctx, traces[i].TraceID); err == nil {
+			traces[i] = trace.Summary
+		}
+	}
+
+	rankTraceCandidates(traces)
+	if len(traces) > limit {
+		traces = traces[:limit]
+	}
+
+	return &model.AnomalyTraceCandidates{
+		AnomalyID:    event.ID,
+		DataSourceID: ds.ID,
+		Service:      service,
+		WindowStart:  start,
+		WindowEnd:    end,
+		Traces:       traces,
+	}, nil
+}
+
+// rankTraceCandidates orders traces by error count, then duration
+func rankTraceCandidates(traces []model.TraceSummary) {
+	sort.SliceStable(traces, func(i, j int) bool {
+		if traces[i].ErrorCount != traces[j].ErrorCount {
+			return traces[i].ErrorCount > traces[j].ErrorCount
+		}
+		return traces[i].DurationMs > traces[j].DurationMs
+	})
+}
+
+// AnomalyWindow returns the time range to search for traces related to an anomaly.
+// TimeRange may hold an RFC 3339 interval ("start/end") or a lookback duration;
+// otherwise a window around the detection time is used.
+func AnomalyWindow(event *model.AnomalyEvent) (time.Time, time.Time) {
+	detected := event.CreatedAt
+	if detected.IsZero() {
+		detected = time.Now()
+	}
+
+	if from, to, ok := strings.Cut(event.TimeRange, "/"); ok {
+		start, err1 := time.Parse(time.RFC3339, strings.TrimSpace(from))
+		end, err2 := time.Parse(time.RFC3339, strings.TrimSpace(to))
+		if err1 == nil && err2 == nil && start.Before(end) {
+			return start, end
+		}
+	}
+	if lookback, err := time.ParseDuration(event.TimeRange); err == nil && lookback > 0 {
+		return detected.Add(-lookback), detected.Add(anomalyWindowAfter)
+	}
+	return detected.Add(-anomalyWindowBefore), detected.Add(anomalyWindowAfter)
+}
+
+// AnomalyService returns the service named in the anomaly's labels, if any
+func AnomalyService(event *model.AnomalyEvent) string {
+	if event.Labels == "" {
+		return ""
+	}
+	var labels map[string]string
+	if err := json.Unmarshal([]byte(event.Labels), &labels); err != nil {
+		return ""
+	}
+	for _, key := range anomalyServiceLabels {
+		if v := labels[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
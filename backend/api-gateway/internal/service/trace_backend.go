@@ -0,0 +1,518 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/model"
+)
+
+// ErrTraceNotFound is returned when the backend has no trace with the requested ID
+var ErrTraceNotFound = errors.New("trace not found")
+
+// traceIDPattern matches hex trace IDs as used by Tempo and Jaeger
+var traceIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{1,32}$`)
+
+// TraceBackend queries a distributed tracing backend
+type TraceBackend interface {
+	// Ping checks that the backend is reachable and answering queries
+	Ping(ctx context.Context) error
+	// Search returns traces matching the query, newest first
+	Search(ctx context.Context, query *model.TraceSearchQuery) ([]model.TraceSummary, error)
+	// GetTrace returns a complete trace
+	GetTrace(ctx context.Context, traceID string) (*model.Trace, error)
+}
+
+// NewTraceBackend creates a client for the data source's backend type
+func NewTraceBackend(ds *model.TraceDataSource) (TraceBackend, error) {
+	client, err := newTraceHTTPClient(ds.URL, ds.Headers, ds.TenantID, ds.Username, ds.Password, ds.Token, ds.InsecureSkipTLS)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ds.Type {
+	case model.TraceBackendTempo:
+		return &tempoBackend{client}, nil
+	case model.TraceBackendJaeger:
+		return &jaegerBackend{client}, nil
+	}
+	return nil, fmt.Errorf("unsupported trace backend type: %s", ds.Type)
+}
+
+// traceHTTPClient performs authenticated JSON requests against a Grafana-stack style
+// backend (Tempo, Jaeger, Loki)
+type traceHTTPClient struct {
+	baseURL  string
+	headers  map[string]string
+	username string
+	password string
+	token    string
+	http     *http.Client
+}
+
+// newTraceHTTPClient builds a client from data source settings. headersJSON is a JSON
+// object of extra headers; tenantID is sent as X-Scope-OrgID.
+func newTraceHTTPClient(rawURL, headersJSON, tenantID, username, password, token string, insecureSkipTLS bool) (*traceHTTPClient, error) {
+	base, err := url.Parse(strings.TrimRight(rawURL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid data source URL: %s", rawURL)
+	}
+
+	headers := map[string]string{}
+	if headersJSON != "" {
+		if err := json.Unmarshal([]byte(headersJSON), &headers); err != nil {
+			return nil, fmt.Errorf("invalid headers: %w", err)
+		}
+	}
+	if tenantID != "" {
+		headers["X-Scope-OrgID"] = tenantID
+	}
+
+	return &traceHTTPClient{
+		baseURL:  base.String(),
+		headers:  headers,
+		username: username,
+		password: password,
+		token:    token,
+		http: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: insecureSkipTLS},
+			},
+		},
+	}, nil
+}
+
+// get fetches path and decodes the JSON response into out. A 404 is reported as ErrTraceNotFound.
+func (c *traceHTTPClient) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrTraceNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("backend returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid backend response: %w", err)
+	}
+	return nil
+}
+
+// ============== Tempo ==============
+
+// tempoBackend queries the Tempo HTTP API
+type tempoBackend struct {
+	client *traceHTTPClient
+}
+
+func (b *tempoBackend) Ping(ctx context.Context) error {
+	return b.client.get(ctx, "/api/echo", nil, nil)
+}
+
+func (b *tempoBackend) Search(ctx context.Context, query *model.TraceSearchQuery) ([]model.TraceSummary, error) {
+	// Tempo takes tag filters in logfmt
+	var tags []string
+	if query.Service != "" {
+		tags = append(tags, "service.name="+strconv.Quote(query.Service))
+	}
+	if query.Operation != "" {
+		tags = append(tags, "name="+strconv.Quote(query.Operation))
+	}
+	for _, k := range sortedKeys(query.Tags) {
+		tags = append(tags, k+"="+strconv.Quote(query.Tags[k]))
+	}
+
+	params := url.Values{}
+	if len(tags) > 0 {
+		params.Set("tags", strings.Join(tags, " "))
+	}
+	if query.MinDuration > 0 {
+		params.Set("minDuration", query.MinDuration.String())
+	}
+	if query.MaxDuration > 0 {
+		params.Set("maxDuration", query.MaxDuration.String())
+	}
+	params.Set("start", strconv.FormatInt(query.Start.Unix(), 10))
+	params.Set("end", strconv.FormatInt(query.End.Unix(), 10))
+	params.Set("limit", strconv.Itoa(query.Limit))
+
+	var resp struct {
+		Traces []struct {
+			TraceID           string    `json:"traceID"`
+			RootServiceName   string    `json:"rootServiceName"`
+			RootTraceName     string    `json:"rootTraceName"`
+			StartTimeUnixNano flexInt64 `json:"startTimeUnixNano"`
+			DurationMs        float64   `json:"durationMs"`
+		} `json:"traces"`
+	}
+	if err := b.client.get(ctx, "/api/search", params, &resp); err != nil {
+		return nil, err
+	}
+
+	summaries := make([]model.TraceSummary, 0, len(resp.Traces))
+	for _, t := range resp.Traces {
+		summaries = append(summaries, model.TraceSummary{
+			TraceID:       t.TraceID,
+			RootService:   t.RootServiceName,
+			RootOperation: t.RootTraceName,
+			StartTime:     time.Unix(0, int64(t.StartTimeUnixNano)),
+			DurationMs:    t.DurationMs,
+		})
+	}
+	return summaries, nil
+}
+
+func (b *tempoBackend) GetTrace(ctx context.Context, traceID string) (*model.Trace, error) {
+	var resp struct {
+		Batches       []otlpResourceSpans `json:"batches"`
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	if err := b.client.get(ctx, "/api/traces/"+traceID, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	var spans []model.Span
+	for _, rs := range append(resp.Batches, resp.ResourceSpans...) {
+		service := otlpAttributes(rs.Resource.Attributes)["service.name"]
+		for _, ss := range append(rs.ScopeSpans, rs.InstrumentationLibrarySpans...) {
+			for _, s := range ss.Spans {
+				attrs := otlpAttributes(s.Attributes)
+				start := int64(s.StartTimeUnixNano)
+				spans = append(spans, model.Span{
+					SpanID:       otlpID(s.SpanID),
+					ParentSpanID: otlpID(s.ParentSpanID),
+					Service:      service,
+					Operation:    s.Name,
+					StartTime:    time.Unix(0, start),
+					DurationMs:   float64(int64(s.EndTimeUnixNano)-start) / 1e6,
+					Error:        s.Status.isError(),
+					Attributes:   attrs,
+				})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return nil, ErrTraceNotFound
+	}
+	return buildTrace(strings.ToLower(traceID), spans), nil
+}
+
+// otlpResourceSpans is the OTLP JSON encoding of spans grouped by resource
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans                  []otlpScopeSpans `json:"scopeSpans"`
+	InstrumentationLibrarySpans []otlpScopeSpans `json:"instrumentationLibrarySpans"` // pre-1.0 OTLP
+}
+
+type otlpScopeSpans struct {
+	Spans []struct {
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId"`
+		Name              string         `json:"name"`
+		StartTimeUnixNano flexInt64      `json:"startTimeUnixNano"`
+		EndTimeUnixNano   flexInt64      `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes"`
+		Status            otlpStatus     `json:"status"`
+	} `json:"spans"`
+}
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue *string    `json:"stringValue"`
+		IntValue    *flexInt64 `json:"intValue"`
+		BoolValue   *bool      `json:"boolValue"`
+		DoubleValue *float64   `json:"doubleValue"`
+	} `json:"value"`
+}
+
+// otlpStatus holds a span status code, encoded as a name or a number depending on the exporter
+type otlpStatus struct {
+	Code json.RawMessage `json:"code"`
+}
+
+func (s otlpStatus) isError() bool {
+	code := strings.Trim(string(s.Code), `"`)
+	return code == "2" || code == "STATUS_CODE_ERROR"
+}
+
+// otlpAttributes flattens OTLP attributes to strings
+func otlpAttributes(kvs []otlpKeyValue) map[string]string {
+	attrs := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		switch v := kv.Value; {
+		case v.StringValue != nil:
+			attrs[kv.Key] = *v.StringValue
+		case v.IntValue != nil:
+			attrs[kv.Key] = strconv.FormatInt(int64(*v.IntValue), 10)
+		case v.BoolValue != nil:
+			attrs[kv.Key] = strconv.FormatBool(*v.BoolValue)
+		case v.DoubleValue != nil:
+			attrs[kv.Key] = strconv.FormatFloat(*v.DoubleValue, 'f', -1, 64)
+		}
+	}
+	return attrs
+}
+
+// otlpID converts a span ID to hex; protobuf JSON encodes IDs as base64
+func otlpID(id string) string {
+	if id == "" || (traceIDPattern.MatchString(id) && len(id)%2 == 0) {
+		return strings.ToLower(id)
+	}
+	if raw, err := base64.StdEncoding.DecodeString(id); err == nil {
+		return hex.EncodeToString(raw)
+	}
+	return id
+}
+
+// flexInt64 decodes integers encoded either as JSON numbers or as strings
+type flexInt64 int64
+
+func (n *flexInt64) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*n = flexInt64(v)
+	return nil
+}
+
+// ============== Jaeger ==============
+
+// jaegerBackend queries the Jaeger query service HTTP API
+type jaegerBackend struct {
+	client *traceHTTPClient
+}
+
+type jaegerTrace struct {
+	TraceID string `json:"traceID"`
+	Spans   []struct {
+		SpanID        string `json:"spanID"`
+		OperationName string `json:"operationName"`
+		References    []struct {
+			RefType string `json:"refType"`
+			SpanID  string `json:"spanID"`
+		} `json:"references"`
+		StartTime int64 `json:"startTime"` // microseconds
+		Duration  int64 `json:"duration"`  // microseconds
+		Tags      []struct {
+			Key   string      `json:"key"`
+			Value interface{} `json:"value"`
+		} `json:"tags"`
+		ProcessID string `json:"processID"`
+	} `json:"spans"`
+	Processes map[string]struct {
+		ServiceName string `json:"serviceName"`
+	} `json:"processes"`
+}
+
+type jaegerResponse struct {
+	Data   []jaegerTrace `json:"data"`
+	Errors []struct {
+		Msg string `json:"msg"`
+	} `json:"errors"`
+}
+
+func (r *jaegerResponse) err() error {
+	if len(r.Errors) > 0 {
+		return fmt.Errorf("jaeger: %s", r.Errors[0].Msg)
+	}
+	return nil
+}
+
+func (b *jaegerBackend) Ping(ctx context.Context) error {
+	return b.client.get(ctx, "/api/services", nil, nil)
+}
+
+func (b *jaegerBackend) Search(ctx context.Context, query *model.TraceSearchQuery) ([]model.TraceSummary, error) {
+	if query.Service == "" {
+		return nil, errors.New("service is required when searching Jaeger")
+	}
+
+	params := url.Values{}
+	params.Set("service", query.Service)
+	if query.Operation != "" {
+		params.Set("operation", query.Operation)
+	}
+	if len(query.Tags) > 0 {
+		tags, _ := json.Marshal(query.Tags)
+		params.Set("tags", string(tags))
+	}
+	if query.MinDuration > 0 {
+		params.Set("minDuration", query.MinDuration.String())
+	}
+	if query.MaxDuration > 0 {
+		params.Set("maxDuration", query.MaxDuration.String())
+	}
+	params.Set("start", strconv.FormatInt(query.Start.UnixMicro(), 10))
+	params.Set("end", strconv.FormatInt(query.End.UnixMicro(), 10))
+	params.Set("limit", strconv.Itoa(query.Limit))
+
+	var resp jaegerResponse
+	if err := b.client.get(ctx, "/api/traces", params, &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.err(); err != nil {
+		return nil, err
+	}
+
+	summaries := make([]model.TraceSummary, 0, len(resp.Data))
+	for i := range resp.Data {
+		summaries = append(summaries, jaegerToTrace(&resp.Data[i]).Summary)
+	}
+	return summaries, nil
+}
+
+func (b *jaegerBackend) GetTrace(ctx context.Context, traceID string) (*model.Trace, error) {
+	var resp jaegerResponse
+	if err := b.client.get(ctx, "/api/traces/"+traceID, nil, &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.err(); err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, ErrTraceNotFound
+	}
+	return jaegerToTrace(&resp.Data[0]), nil
+}
+
+// jaegerToTrace converts a Jaeger trace to the common trace model
+func jaegerToTrace(t *jaegerTrace) *model.Trace {
+	spans := make([]model.Span, 0, len(t.Spans))
+	for _, s := range t.Spans {
+		span := model.Span{
+			SpanID:     s.SpanID,
+			Service:    t.Processes[s.ProcessID].ServiceName,
+			Operation:  s.OperationName,
+			StartTime:  time.UnixMicro(s.StartTime),
+			DurationMs: float64(s.Duration) / 1e3,
+			Attributes: make(map[string]string, len(s.Tags)),
+		}
+		for _, ref := range s.References {
+			if ref.RefType == "CHILD_OF" {
+				span.ParentSpanID = ref.SpanID
+				break
+			}
+		}
+		for _, tag := range s.Tags {
+			value := fmt.Sprint(tag.Value)
+			span.Attributes[tag.Key] = value
+			if (tag.Key == "error" && value == "true") || (tag.Key == "otel.status_code" && value == "ERROR") {
+				span.Error = true
+			}
+		}
+		spans = append(spans, span)
+	}
+	return buildTrace(t.TraceID, spans)
+}
+
+// ============== Shared ==============
+
+// buildTrace orders spans by start time and summarizes the trace
+func buildTrace(traceID string, spans []model.Span) *model.Trace {
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].StartTime.Before(spans[j].StartTime)
+	})
+
+	summary := model.TraceSummary{TraceID: traceID, SpanCount: len(spans)}
+	if len(spans) == 0 {
+		return &model.Trace{TraceID: traceID, Summary: summary, Spans: spans}
+	}
+
+	ids := make(map[string]bool, len(spans))
+	for _, s := range spans {
+		ids[s.SpanID] = true
+	}
+
+	start := spans[0].StartTime
+	end := start
+	services := map[string]bool{}
+	root := &spans[0]
+	foundRoot := false
+	for i := range spans {
+		s := &spans[i]
+		if spanEnd := s.StartTime.Add(time.Duration(s.DurationMs * float64(time.Millisecond))); spanEnd.After(end) {
+			end = spanEnd
+		}
+		if s.Error {
+			summary.ErrorCount++
+		}
+		if s.Service != "" {
+			services[s.Service] = true
+		}
+		// The root is the earliest span whose parent is not part of the trace
+		if !foundRoot && (s.ParentSpanID == "" || !ids[s.ParentSpanID]) {
+			root = s
+			foundRoot = true
+		}
+	}
+
+	summary.RootService = root.Service
+	summary.RootOperation = root.Operation
+	summary.StartTime = start
+	summary.DurationMs = float64(end.Sub(start)) / float64(time.Millisecond)
+	for service := range services {
+		summary.Services = append(summary.Services, service)
+	}
+	sort.Strings(summary.Services)
+
+	return &model.Trace{TraceID: traceID, Summary: summary, Spans: spans}
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
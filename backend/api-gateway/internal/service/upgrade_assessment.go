@@ -0,0 +1,281 @@
+// Package service provides upgrade assessments that find the deprecated and
+// removed Kubernetes APIs a cluster still uses
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// JobTypeUpgradeAssessment is the job that scans a cluster for a pending upgrade assessment
+const JobTypeUpgradeAssessment = "cluster.upgrade_assessment"
+
+// upgradeAssessmentTimeout bounds the scan of a cluster's objects and Helm releases
+const upgradeAssessmentTimeout = 10 * time.Minute
+
+var (
+	// ErrInvalidUpgradeAssessment is returned for target versions that cannot be assessed
+	ErrInvalidUpgradeAssessment = errors.New("invalid upgrade assessment")
+	// ErrUpgradeClusterNotFound is returned when the cluster does not exist
+	ErrUpgradeClusterNotFound = errors.New("cluster not found")
+	// ErrUpgradeAssessmentNotFound is returned when the assessment does not exist
+	ErrUpgradeAssessmentNotFound = errors.New("upgrade assessment not found")
+)
+
+// upgradeAssessmentJob is the payload of a cluster.upgrade_assessment job
+type upgradeAssessmentJob struct {
+	AssessmentID uuid.UUID `json:"assessmentId"`
+}
+
+// UpgradeAssessmentService assesses clusters ahead of a Kubernetes upgrade by
+// scanning their live objects and deployed Helm releases for API versions the
+// target version deprecates or no longer serves
+type UpgradeAssessmentService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	jobs   *JobQueue
+}
+
+// NewUpgradeAssessmentService creates a new upgrade assessment service and
+// registers the assessment job with the queue
+func NewUpgradeAssessmentService(db *gorm.DB, logger *zap.Logger, jobs *JobQueue) *UpgradeAssessmentService {
+	s := &UpgradeAssessmentService{db: db, logger: logger, jobs: jobs}
+	jobs.Register(JobTypeUpgradeAssessment, s.assessJob, JobTypeOptions{MaxAttempts: 3, VisibilityTimeout: upgradeAssessmentTimeout + time.Minute})
+	return s
+}
+
+// Run queues an assessment of the cluster for req.TargetVersion, by default
+// the minor release after the cluster's. The assessment is pending until the
+// job queue has scanned the cluster.
+func (s *UpgradeAssessmentService) Run(userID, clusterID uuid.UUID, req *model.RunUpgradeAssessmentRequest) (*model.ClusterUpgradeAssessmentResponse, error) {
+	var cluster model.K8sCluster
+	if err := s.db.Select("id", "name", "version").First(&cluster, "id = ?", clusterID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUpgradeClusterNotFound
+		}
+		return nil, err
+	}
+	target, err := upgradeTarget(cluster.Version, req.TargetVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	assessment := &model.ClusterUpgradeAssessment{
+		ClusterID:      cluster.ID,
+		ClusterName:    cluster.Name,
+		TriggeredBy:    &userID,
+		CurrentVersion: cluster.Version,
+		TargetVersion:  target,
+		Status:         model.UpgradeAssessmentPending,
+	}
+	if err := s.db.Create(assessment).Error; err != nil {
+		return nil, err
+	}
+	if _, err := s.jobs.Enqueue(JobTypeUpgradeAssessment, upgradeAssessmentJob{AssessmentID: assessment.ID}, JobOptions{}); err != nil {
+		s.db.Delete(&model.ClusterUpgradeAssessment{}, "id = ?", assessment.ID)
+		return nil, err
+	}
+	resp := assessment.Response()
+	return &resp, nil
+}
+
+// upgradeTarget validates a target version against the cluster's current one
+// and returns its minor release
+func upgradeTarget(current, target string) (string, error) {
+	curMajor, curMinor, curErr := k8s.ParseKubernetesVersion(current)
+	if target == "" {
+		if curErr != nil {
+			return "", fmt.Errorf("%w: targetVersion is required when the cluster's version is unknown", ErrInvalidUpgradeAssessment)
+		}
+		return fmt.Sprintf("%d.%d", curMajor, curMinor+1), nil
+	}
+	major, minor, err := k8s.ParseKubernetesVersion(target)
+	if err != nil || major != 1 {
+		return "", fmt.Errorf("%w: targetVersion must be a Kubernetes version such as 1.29", ErrInvalidUpgradeAssessment)
+	}
+	if curErr == nil && (major < curMajor || (major == curMajor && minor < curMinor)) {
+		return "", fmt.Errorf("%w: targetVersion is older than the cluster's version %s", ErrInvalidUpgradeAssessment, current)
+	}
+	return fmt.Sprintf("%d.%d", major, minor), nil
+}
+
+// List lists a cluster's assessments, newest first, without their findings
+func (s *UpgradeAssessmentService) List(clusterID uuid.UUID, limit int) ([]model.ClusterUpgradeAssessment, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	assessments := []model.ClusterUpgradeAssessment{}
+	err := s.db.Omit("findings").Where("cluster_id = ?", clusterID).Order("created_at DESC").Limit(limit).Find(&assessments).Error
+	return assessments, err
+}
+
+// Get gets an assessment of the cluster with its findings
+func (s *UpgradeAssessmentService) Get(clusterID, id uuid.UUID) (*model.ClusterUpgradeAssessmentResponse, error) {
+	return s.first(s.db.Where("id = ? AND cluster_id = ?", id, clusterID))
+}
+
+// Latest gets the cluster's most recent assessment with its findings
+func (s *UpgradeAssessmentService) Latest(clusterID uuid.UUID) (*model.ClusterUpgradeAssessmentResponse, error) {
+	return s.first(s.db.Where("cluster_id = ?", clusterID).Order("created_at DESC"))
+}
+
+func (s *UpgradeAssessmentService) first(query *gorm.DB) (*model.ClusterUpgradeAssessmentResponse, error) {
+	var assessment model.ClusterUpgradeAssessment
+	if err := query.First(&assessment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUpgradeAssessmentNotFound
+		}
+		return nil, err
+	}
+	resp := assessment.Response()
+	return &resp, nil
+}
+
+// assessJob scans the cluster of a pending assessment
+func (s *UpgradeAssessmentService) assessJob(ctx context.Context, job *model.Job) error {
+	var payload upgradeAssessmentJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	var assessment model.ClusterUpgradeAssessment
+	if err := s.db.First(&assessment, "id = ?", payload.AssessmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // Deleted with its cluster while queued
+		}
+		return err
+	}
+	if assessment.Status != model.UpgradeAssessmentPending {
+		return nil
+	}
+
+	version, findings, err := s.assess(ctx, &assessment)
+	if err != nil {
+		if job.Attempts >= job.MaxAttempts {
+			s.finish(&assessment, "", nil, err)
+		}
+		return err
+	}
+	return s.finish(&assessment, version, findings, nil)
+}
+
+// assess returns the cluster's version and the findings of its deprecated API uses
+func (s *UpgradeAssessmentService) assess(ctx context.Context, assessment *model.ClusterUpgradeAssessment) (string, []model.DeprecatedAPIFinding, error) {
+	var cluster model.K8sCluster
+	if err := s.db.First(&cluster, "id = ?", assessment.ClusterID).Error; err != nil {
+		return "", nil, fmt.Errorf("cluster not found")
+	}
+	client, err := k8s.NewClusterClient(&k8s.ClusterConfig{Kubeconfig: []byte(cluster.Kubeconfig), Endpoint: cluster.Endpoint})
+	if err != nil {
+		return "", nil, err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, upgradeAssessmentTimeout)
+	defer cancel()
+
+	version, err := client.ServerVersion()
+	if err != nil {
+		return "", nil, err
+	}
+	uses, err := client.FindDeprecatedAPIUses(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	return version, upgradeFindings(uses, assessment.TargetVersion), nil
+}
+
+// upgradeFindings rates the deprecated API uses against the target version:
+// critical when the target no longer serves the API, a warning when it still
+// serves it deprecated. Uses of APIs deprecated after the target are left out.
+// Critical findings come first.
+func upgradeFindings(uses []k8s.APIVersionUse, target string) []model.DeprecatedAPIFinding {
+	_, targetMinor, _ := k8s.ParseKubernetesVersion(target)
+	findings := []model.DeprecatedAPIFinding{}
+	for _, use := range uses {
+		_, removedIn, _ := k8s.ParseKubernetesVersion(use.RemovedIn)
+		_, deprecatedIn, _ := k8s.ParseKubernetesVersion(use.DeprecatedIn)
+		var severity string
+		switch {
+		case removedIn <= targetMinor:
+			severity = model.UpgradeSeverityCritical
+		case deprecatedIn <= targetMinor:
+			severity = model.UpgradeSeverityWarning
+		default:
+			continue
+		}
+		findings = append(findings, model.DeprecatedAPIFinding{
+			Severity:     severity,
+			Source:       use.Source,
+			APIVersion:   use.APIVersion,
+			Kind:         use.Kind,
+			Name:         use.Name,
+			Namespace:    use.Namespace,
+			Release:      use.Release,
+			Manager:      use.Manager,
+			DeprecatedIn: use.DeprecatedIn,
+			RemovedIn:    use.RemovedIn,
+			Replacement:  use.Replacement,
+			Notes:        use.Notes,
+		})
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Severity != b.Severity {
+			return a.Severity == model.UpgradeSeverityCritical
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return findings
+}
+
+// finish stores an assessment's findings or the error it failed with
+func (s *UpgradeAssessmentService) finish(assessment *model.ClusterUpgradeAssessment, version string, findings []model.DeprecatedAPIFinding, failure error) error {
+	updates := map[string]interface{}{"completed_at": time.Now()}
+	if failure != nil {
+		updates["status"] = model.UpgradeAssessmentFailed
+		updates["error"] = failure.Error()
+	} else {
+		encoded, err := json.Marshal(findings)
+		if err != nil {
+			return err
+		}
+		critical := 0
+		for _, finding := range findings {
+			if finding.Severity == model.UpgradeSeverityCritical {
+				critical++
+			}
+		}
+		updates["status"] = model.UpgradeAssessmentCompleted
+		updates["current_version"] = version
+		updates["critical"] = critical
+		updates["warnings"] = len(findings) - critical
+		updates["findings"] = string(encoded)
+	}
+	err := s.db.Model(&model.ClusterUpgradeAssessment{}).
+		Where("id = ? AND status = ?", assessment.ID, model.UpgradeAssessmentPending).Updates(updates).Error
+	if err != nil {
+		return err
+	}
+	s.logger.Info("Assessed cluster upgrade",
+		zap.String("cluster", assessment.ClusterName),
+		zap.String("targetVersion", assessment.TargetVersion),
+		zap.Any("status", updates["status"]),
+		zap.Int("findings", len(findings)))
+	return nil
+}
@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/db"
 	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -75,7 +77,7 @@ func (s *UserService) ListUsers(page, pageSize int, search string) ([]model.User
 	query := s.db.Model(&model.User{})
 
 	if search != "" {
-		searchPattern := "%" + search + "%"
+		searchPattern := sanitize.Contains(search)
 		query = query.Where("username LIKE ? OR email LIKE ? OR display_name LIKE ?", searchPattern, searchPattern, searchPattern)
 	}
 
@@ -196,13 +198,8 @@ func (s *UserService) DeleteRole(roleID uuid.UUID) error {
 		return errors.New("cannot delete system role")
 	}
 
-	// Remove all user associations
-	s.db.Where("role_id = ?", roleID).Delete(&model.UserRole{})
-
-	// Remove all permission associations
-	s.db.Where("role_id = ?", roleID).Delete(&model.RolePermission{})
-
-	return s.db.Delete(&role).Error
+	// Remove the role with its user and permission associations
+	return db.DeleteWithChildren(s.db, &role, "role_id", roleID, &model.UserRole{}, &model.RolePermission{})
 }
 
 // AssignRoleToRole assigns a permission to a role
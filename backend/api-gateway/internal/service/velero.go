@@ -0,0 +1,328 @@
+// Package service provides Velero installation and backups of managed clusters
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"github.com/wangjialin/myops/pkg/k8s"
+	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const (
+	// veleroChart is the Helm chart Velero is installed from
+	veleroChart = "vmware-tanzu/velero"
+	// veleroReleaseName is the name of the Helm release
+	veleroReleaseName = "velero"
+	// defaultVeleroNamespace is where Velero is installed unless asked otherwise
+	defaultVeleroNamespace = "velero"
+)
+
+// veleroPlugins are the provider plugin images added to the Velero deployment
+var veleroPlugins = map[model.VeleroProvider]string{
+	model.VeleroProviderAWS:   "velero/velero-plugin-for-aws:v1.10.0",
+	model.VeleroProviderGCP:   "velero/velero-plugin-for-gcp:v1.10.0",
+	model.VeleroProviderAzure: "velero/velero-plugin-for-microsoft-azure:v1.10.0",
+}
+
+// kubernetesName matches names of Kubernetes objects such as namespaces and schedules
+var kubernetesName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+var (
+	// ErrInvalidVeleroRequest is returned when an installation, backup, restore or schedule is malformed
+	ErrInvalidVeleroRequest = errors.New("invalid velero request")
+	// ErrVeleroNotConfigured is returned when the platform has not installed Velero in the cluster
+	ErrVeleroNotConfigured = errors.New("velero has not been installed in this cluster")
+)
+
+// VeleroStatus is the platform's Velero installation in a cluster together with
+// what is running there
+type VeleroStatus struct {
+	Installation *model.VeleroInstallation `json:"installation,omitempty"`
+	Release      *model.HelmRelease        `json:"release,omitempty"`
+	Cluster      *k8s.VeleroStatus         `json:"cluster,omitempty"`
+	Error        string                    `json:"error,omitempty"` // Why the cluster could not be inspected
+}
+
+// VeleroService installs Velero in managed clusters through the Helm engine and
+// validates the backups, restores and schedules created there
+type VeleroService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// NewVeleroService creates a new Velero service
+func NewVeleroService(db *gorm.DB, logger *zap.Logger) *VeleroService {
+	return &VeleroService{db: db, logger: logger}
+}
+
+// Installation gets the cluster's Velero installation, nil when there is none
+func (s *VeleroService) Installation(clusterID uuid.UUID) (*model.VeleroInstallation, error) {
+	var installation model.VeleroInstallation
+	if err := s.db.Where("cluster_id = ?", clusterID).First(&installation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &installation, nil
+}
+
+// Namespace returns the namespace Velero runs in for the cluster
+func (s *VeleroService) Namespace(clusterID uuid.UUID) string {
+	if installation, err := s.Installation(clusterID); err == nil && installation != nil {
+		return installation.Namespace
+	}
+	return defaultVeleroNamespace
+}
+
+// Status reports the cluster's installation and its Helm release, and inspects
+// Velero in the cluster when client is set
+func (s *VeleroService) Status(ctx context.Context, client *k8s.ClusterClient, clusterID uuid.UUID) (*VeleroStatus, error) {
+	installation, err := s.Installation(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	status := &VeleroStatus{Installation: installation}
+	namespace := defaultVeleroNamespace
+	if installation != nil {
+		namespace = installation.Namespace
+		var release model.HelmRelease
+		if err := s.db.Where("id = ?", installation.ReleaseID).First(&release).Error; err == nil {
+			status.Release = &release
+		}
+	}
+	if client != nil {
+		if status.Cluster, err = client.GetVeleroStatus(ctx, namespace); err != nil {
+			status.Error = err.Error()
+		}
+	}
+	return status, nil
+}
+
+// Install installs Velero in the cluster, or reconfigures it, by installing or
+// upgrading its Helm release with values generated from req
+func (s *VeleroService) Install(userID uuid.UUID, cluster *model.K8sCluster, req *model.InstallVeleroRequest) (*model.VeleroInstallation, error) {
+	existing, err := s.Installation(cluster.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	installation := existing
+	if installation == nil {
+		installation = &model.VeleroInstallation{ClusterID: cluster.ID, CreatedBy: userID}
+	}
+	installation.Namespace = strings.TrimSpace(req.Namespace)
+	if installation.Namespace == "" {
+		installation.Namespace = defaultVeleroNamespace
+	}
+	installation.ChartVersion = strings.TrimSpace(req.ChartVersion)
+	installation.Provider = req.Provider
+	installation.Bucket = strings.TrimSpace(req.Bucket)
+	installation.Prefix = strings.Trim(req.Prefix, "/")
+	installation.Region = strings.TrimSpace(req.Region)
+	installation.S3URL = strings.TrimSpace(req.S3URL)
+	installation.SnapshotsEnabled = req.SnapshotsEnabled
+	installation.DefaultTTL = strings.TrimSpace(req.DefaultTTL)
+	if req.Credentials != "" {
+		installation.Credentials = req.Credentials
+	}
+	if err := validateVeleroInstallation(installation); err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Namespace != installation.Namespace {
+		return nil, fmt.Errorf("%w: velero is installed in namespace %s; uninstall it to move it", ErrInvalidVeleroRequest, existing.Namespace)
+	}
+
+	values, err := veleroValues(installation)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var release model.HelmRelease
+		found := existing != nil && tx.Where("id = ?", existing.ReleaseID).First(&release).Error == nil
+		if found {
+			release.Revision++
+			release.Status = model.HelmReleaseStatusPendingUpgrade
+			release.ChartVersion = installation.ChartVersion
+			release.Values = values
+			release.Description = "Reconfigured Velero"
+			if err := tx.Save(&release).Error; err != nil {
+				return err
+			}
+		} else {
+			release = model.HelmRelease{
+				ID:           uuid.New(),
+				UserID:       userID,
+				ClusterID:    cluster.ID,
+				Namespace:    installation.Namespace,
+				Name:         veleroReleaseName,
+				Revision:     1,
+				Status:       model.HelmReleaseStatusPending,
+				Chart:        veleroChart,
+				ChartVersion: installation.ChartVersion,
+				Values:       values,
+				Description:  "Installed Velero for cluster backups",
+			}
+			if err := tx.Create(&release).Error; err != nil {
+				return err
+			}
+		}
+		installation.ReleaseID = release.ID
+		return tx.Save(installation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("velero release requested", zap.String("cluster", cluster.Name),
+		zap.String("namespace", installation.Namespace), zap.String("provider", string(installation.Provider)))
+	return installation, nil
+}
+
+func validateVeleroInstallation(installation *model.VeleroInstallation) error {
+	if !kubernetesName.MatchString(installation.Namespace) {
+		return fmt.Errorf("%w: namespace must be a valid Kubernetes name", ErrInvalidVeleroRequest)
+	}
+	if _, ok := veleroPlugins[installation.Provider]; !ok {
+		return fmt.Errorf("%w: provider must be aws, gcp or azure", ErrInvalidVeleroRequest)
+	}
+	if installation.Bucket == "" {
+		return fmt.Errorf("%w: bucket is required", ErrInvalidVeleroRequest)
+	}
+	if installation.Provider == model.VeleroProviderAWS && installation.Region == "" && installation.S3URL == "" {
+		return fmt.Errorf("%w: region or s3Url is required", ErrInvalidVeleroRequest)
+	}
+	if installation.S3URL != "" && installation.Provider != model.VeleroProviderAWS {
+		return fmt.Errorf("%w: s3Url is only used by the aws provider", ErrInvalidVeleroRequest)
+	}
+	if installation.Credentials == "" {
+		return fmt.Errorf("%w: credentials are required", ErrInvalidVeleroRequest)
+	}
+	if installation.DefaultTTL != "" {
+		if _, err := time.ParseDuration(installation.DefaultTTL); err != nil {
+			return fmt.Errorf("%w: defaultTtl must be a duration such as 720h", ErrInvalidVeleroRequest)
+		}
+	}
+	return nil
+}
+
+// veleroValues renders the chart values: one backup storage location, the
+// provider's plugin and its credentials, and a snapshot location when enabled
+func veleroValues(installation *model.VeleroInstallation) (string, error) {
+	provider := string(installation.Provider)
+	locationConfig := map[string]string{}
+	if installation.Region != "" {
+		locationConfig["region"] = installation.Region
+	}
+	if installation.S3URL != "" {
+		locationConfig["s3Url"] = installation.S3URL
+		locationConfig["s3ForcePathStyle"] = "true"
+	}
+
+	location := map[string]interface{}{
+		"name":     "default",
+		"provider": provider,
+		"bucket":   installation.Bucket,
+		"default":  true,
+		"config":   locationConfig,
+	}
+	if installation.Prefix != "" {
+		location["prefix"] = installation.Prefix
+	}
+	configuration := map[string]interface{}{
+		"backupStorageLocation": []interface{}{location},
+	}
+	if installation.SnapshotsEnabled {
+		snapshotConfig := map[string]string{}
+		if installation.Region != "" {
+			snapshotConfig["region"] = installation.Region
+		}
+		configuration["volumeSnapshotLocation"] = []interface{}{map[string]interface{}{
+			"name":     "default",
+			"provider": provider,
+			"config":   snapshotConfig,
+		}}
+	}
+	if installation.DefaultTTL != "" {
+		configuration["defaultBackupTTL"] = installation.DefaultTTL
+	}
+
+	plugin := veleroPlugins[installation.Provider]
+	values := map[string]interface{}{
+		"configuration": configuration,
+		"credentials": map[string]interface{}{
+			"useSecret":      true,
+			"secretContents": map[string]string{"cloud": installation.Credentials},
+		},
+		"initContainers": []interface{}{map[string]interface{}{
+			"name":         plugin[strings.LastIndex(plugin, "/")+1 : strings.LastIndex(plugin, ":")],
+			"image":        plugin,
+			"volumeMounts": []interface{}{map[string]string{"mountPath": "/target", "name": "plugins"}},
+		}},
+		"snapshotsEnabled": installation.SnapshotsEnabled,
+		"deployNodeAgent":  false,
+	}
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to render velero values: %w", err)
+	}
+	return string(data), nil
+}
+
+// ValidateBackup checks an on-demand or scheduled backup's selection
+func (s *VeleroService) ValidateBackup(spec *k8s.VeleroBackupSpec) error {
+	for _, namespace := range append(append([]string{}, spec.IncludedNamespaces...), spec.ExcludedNamespaces...) {
+		if namespace != "*" && !kubernetesName.MatchString(namespace) {
+			return fmt.Errorf("%w: invalid namespace %q", ErrInvalidVeleroRequest, namespace)
+		}
+	}
+	if err := sanitize.Labels(spec.LabelSelector); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidVeleroRequest, err)
+	}
+	if spec.TTL != "" {
+		if _, err := time.ParseDuration(spec.TTL); err != nil {
+			return fmt.Errorf("%w: ttl must be a duration such as 720h", ErrInvalidVeleroRequest)
+		}
+	}
+	return nil
+}
+
+// ValidateRestore checks a restore names a backup and valid namespaces
+func (s *VeleroService) ValidateRestore(spec *k8s.VeleroRestoreSpec) error {
+	if spec.BackupName == "" {
+		return fmt.Errorf("%w: backupName is required", ErrInvalidVeleroRequest)
+	}
+	for _, namespace := range append(append([]string{}, spec.IncludedNamespaces...), spec.ExcludedNamespaces...) {
+		if namespace != "*" && !kubernetesName.MatchString(namespace) {
+			return fmt.Errorf("%w: invalid namespace %q", ErrInvalidVeleroRequest, namespace)
+		}
+	}
+	for from, to := range spec.NamespaceMapping {
+		if !kubernetesName.MatchString(from) || !kubernetesName.MatchString(to) {
+			return fmt.Errorf("%w: invalid namespace mapping %s: %s", ErrInvalidVeleroRequest, from, to)
+		}
+	}
+	return nil
+}
+
+// ValidateSchedule checks a schedule's name, cron expression and backup template
+func (s *VeleroService) ValidateSchedule(name string, spec *k8s.VeleroScheduleSpec) error {
+	if !kubernetesName.MatchString(name) {
+		return fmt.Errorf("%w: name must be a valid Kubernetes name", ErrInvalidVeleroRequest)
+	}
+	if _, err := cron.ParseStandard(spec.Schedule); err != nil {
+		return fmt.Errorf("%w: invalid schedule: %v", ErrInvalidVeleroRequest, err)
+	}
+	return s.ValidateBackup(&spec.Template)
+}
@@ -0,0 +1,438 @@
+// Package service provides outbound webhook delivery of platform events
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Webhook delivery settings
+const (
+	webhookPollInterval   = 10 * time.Second
+	webhookRequestTimeout = 10 * time.Second
+	webhookBatchSize      = 50
+	webhookRetryBase      = 30 * time.Second
+	webhookRetryMax       = time.Hour
+	webhookStaleClaim     = 5 * time.Minute // Claims older than this are assumed lost
+	webhookResponseChars  = 2000
+	defaultWebhookRetries = 8
+	maxWebhookRetries     = 20
+)
+
+// Headers sent with every delivery
+const (
+	WebhookHeaderEvent     = "X-Webhook-Event"
+	WebhookHeaderDelivery  = "X-Webhook-Delivery"
+	WebhookHeaderTimestamp = "X-Webhook-Timestamp"
+	WebhookHeaderSignature = "X-Webhook-Signature"
+)
+
+// ErrInvalidWebhook is returned for webhook endpoints that cannot be saved
+var ErrInvalidWebhook = errors.New("invalid webhook endpoint")
+
+// WebhookService stores subscriptions and delivers events to them with retries
+type WebhookService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	http   *http.Client
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(db *gorm.DB, logger *zap.Logger) *WebhookService {
+	return &WebhookService{
+		db:     db,
+		logger: logger,
+		http:   &http.Client{Timeout: webhookRequestTimeout},
+	}
+}
+
+// HandleEvent queues the event for every enabled endpoint of the user that subscribes
+// to it and whose filters match its attributes, then attempts the deliveries in the
+// background. It is registered as an event bus handler; problems are logged.
+func (s *WebhookService) HandleEvent(userID uuid.UUID, event *model.PlatformEvent) {
+	var endpoints []model.WebhookEndpoint
+	if err := s.db.Where("user_id = ? AND enabled = ?", userID, true).Find(&endpoints).Error; err != nil {
+		s.logger.Error("failed to load webhook endpoints", zap.String("event", string(event.Type)), zap.Error(err))
+		return
+	}
+
+	var matched []model.WebhookEndpoint
+	for _, endpoint := range endpoints {
+		resp := endpoint.Response()
+		if subscribes(resp.Events, event.Type) && MatchEventFilters(resp.Filters, event.Attributes) {
+			matched = append(matched, endpoint)
+		}
+	}
+	if len(matched) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error("failed to encode webhook event", zap.String("event", string(event.Type)), zap.Error(err))
+		return
+	}
+
+	deliveries := s.queue(matched, event, payload)
+	go func() {
+		for i := range deliveries {
+			s.attempt(context.Background(), &deliveries[i])
+		}
+	}()
+}
+
+// queue stores a pending delivery of the payload for each endpoint
+func (s *WebhookService) queue(endpoints []model.WebhookEndpoint, event *model.PlatformEvent, payload []byte) []model.WebhookDelivery {
+	now := time.Now()
+	deliveries := make([]model.WebhookDelivery, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		delivery := model.WebhookDelivery{
+			EndpointID:    endpoint.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        model.WebhookDeliveryPending,
+			NextAttemptAt: &now,
+		}
+		if err := s.db.Create(&delivery).Error; err != nil {
+			s.logger.Error("failed to queue webhook delivery",
+				zap.String("endpointId", endpoint.ID.String()),
+				zap.Error(err),
+			)
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries
+}
+
+// Run retries due deliveries until ctx is cancelled
+func (s *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.DeliverDue(ctx)
+		}
+	}
+}
+
+// DeliverDue attempts pending deliveries whose retry time has come
+func (s *WebhookService) DeliverDue(ctx context.Context) {
+	now := time.Now()
+
+	// Recover deliveries claimed by an attempt that never finished
+	s.db.Model(&model.WebhookDelivery{}).
+		Where("status = ? AND last_attempt_at < ?", model.WebhookDeliveryInProgress, now.Add(-webhookStaleClaim)).
+		Update("status", model.WebhookDeliveryPending)
+
+	var due []model.WebhookDelivery
+	err := s.db.Where("status = ? AND next_attempt_at <= ?", model.WebhookDeliveryPending, now).
+		Order("next_attempt_at").Limit(webhookBatchSize).Find(&due).Error
+	if err != nil {
+		s.logger.Error("failed to load due webhook deliveries", zap.Error(err))
+		return
+	}
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		s.attempt(ctx, &due[i])
+	}
+}
+
+// attempt claims a pending delivery and sends it once, scheduling a retry on failure
+func (s *WebhookService) attempt(ctx context.Context, delivery *model.WebhookDelivery) {
+	// Claim the delivery so concurrent workers do not send it twice
+	now := time.Now()
+	claim := s.db.Model(&model.WebhookDelivery{}).
+		Where("id = ? AND status = ?", delivery.ID, model.WebhookDeliveryPending).
+		Updates(map[string]interface{}{"status": model.WebhookDeliveryInProgress, "last_attempt_at": now})
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return
+	}
+
+	var endpoint model.WebhookEndpoint
+	if err := s.db.First(&endpoint, "id = ?", delivery.EndpointID).Error; err != nil {
+		delivery.Status = model.WebhookDeliveryFailed
+		delivery.Error = "endpoint no longer exists"
+		delivery.NextAttemptAt = nil
+		s.db.Save(delivery)
+		return
+	}
+	if !endpoint.Enabled {
+		delivery.Status = model.WebhookDeliveryFailed
+		delivery.Error = "endpoint is disabled"
+		delivery.NextAttemptAt = nil
+		s.db.Save(delivery)
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	status, body, err := s.send(ctx, &endpoint, delivery)
+	delivery.DurationMs = time.Since(now).Milliseconds()
+	delivery.ResponseStatus = status
+	delivery.ResponseBody = body
+	delivery.Error = ""
+
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		delivery.Status = model.WebhookDeliverySucceeded
+		delivery.NextAttemptAt = nil
+	default:
+		if err != nil {
+			delivery.Error = err.Error()
+		} else {
+			delivery.Error = fmt.Sprintf("endpoint responded with status %d", status)
+		}
+		maxAttempts := endpoint.MaxAttempts
+		if maxAttempts <= 0 {
+			maxAttempts = defaultWebhookRetries
+		}
+		if delivery.Attempts >= maxAttempts {
+			delivery.Status = model.WebhookDeliveryFailed
+			delivery.NextAttemptAt = nil
+		} else {
+			next := now.Add(webhookBackoff(delivery.Attempts))
+			delivery.Status = model.WebhookDeliveryPending
+			delivery.NextAttemptAt = &next
+		}
+	}
+
+	if err := s.db.Save(delivery).Error; err != nil {
+		s.logger.Error("failed to record webhook delivery",
+			zap.String("deliveryId", delivery.ID.String()),
+			zap.Error(err),
+		)
+	}
+}
+
+// send posts the payload signed with the endpoint secret. The signature is the hex
+// HMAC-SHA256 of "<timestamp>.<body>", so receivers can reject replays.
+func (s *WebhookService) send(ctx context.Context, endpoint *model.WebhookEndpoint, delivery *model.WebhookDelivery) (int, string, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "myops-webhooks/1.0")
+	req.Header.Set(WebhookHeaderEvent, string(delivery.EventType))
+	req.Header.Set(WebhookHeaderDelivery, delivery.ID.String())
+	req.Header.Set(WebhookHeaderTimestamp, timestamp)
+	req.Header.Set(WebhookHeaderSignature, "sha256="+SignWebhookPayload(endpoint.Secret, timestamp, []byte(delivery.Payload)))
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseChars))
+	return resp.StatusCode, string(body), nil
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 signature of a delivery
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff doubles the retry delay after each failed attempt, up to webhookRetryMax
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempts && delay < webhookRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookRetryMax)
+}
+
+// Redrive queues a delivery to be sent again with a fresh set of attempts
+func (s *WebhookService) Redrive(userID, deliveryID uuid.UUID) (*model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	err := s.db.Joins("JOIN webhook_endpoints ON webhook_endpoints.id = webhook_deliveries.endpoint_id").
+		Where("webhook_deliveries.id = ? AND webhook_endpoints.user_id = ?", deliveryID, userID).
+		First(&delivery).Error
+	if err != nil {
+		return nil, err
+	}
+	if delivery.Status == model.WebhookDeliveryInProgress {
+		return nil, fmt.Errorf("%w: delivery is in progress", ErrInvalidWebhook)
+	}
+
+	now := time.Now()
+	delivery.Status = model.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	if err := s.db.Save(&delivery).Error; err != nil {
+		return nil, err
+	}
+	go s.attempt(context.Background(), &delivery)
+	return &delivery, nil
+}
+
+// Ping queues a test delivery to one endpoint regardless of its subscription
+func (s *WebhookService) Ping(endpoint *model.WebhookEndpoint) (*model.WebhookDelivery, error) {
+	event := &model.PlatformEvent{
+		ID:         uuid.New(),
+		Type:       model.EventWebhookPing,
+		OccurredAt: time.Now().UTC(),
+		Data:       map[string]string{"endpointId": endpoint.ID.String(), "name": endpoint.Name},
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := s.queue([]model.WebhookEndpoint{*endpoint}, event, payload)
+	if len(deliveries) == 0 {
+		return nil, fmt.Errorf("failed to queue test delivery")
+	}
+	s.attempt(context.Background(), &deliveries[0])
+	return &deliveries[0], nil
+}
+
+// BuildWebhookEndpoint validates a create request into an endpoint. The returned
+// secret is the signing key, generated when the request has none.
+func BuildWebhookEndpoint(userID uuid.UUID, req *model.CreateWebhookEndpointRequest) (*model.WebhookEndpoint, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidWebhook)
+	}
+	endpoint := &model.WebhookEndpoint{
+		UserID:      userID,
+		Name:        req.Name,
+		Description: req.Description,
+		URL:         req.URL,
+		Secret:      req.Secret,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+		MaxAttempts: req.MaxAttempts,
+	}
+	if err := ApplyWebhookSubscription(endpoint, req.Events, req.Filters); err != nil {
+		return nil, err
+	}
+	if err := validateWebhookEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	if endpoint.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		endpoint.Secret = hex.EncodeToString(secret)
+	}
+	return endpoint, nil
+}
+
+// ApplyWebhookUpdate applies an update request to an endpoint
+func ApplyWebhookUpdate(endpoint *model.WebhookEndpoint, req *model.UpdateWebhookEndpointRequest) error {
+	if req.Name != nil {
+		endpoint.Name = *req.Name
+	}
+	if req.Description != nil {
+		endpoint.Description = *req.Description
+	}
+	if req.URL != nil {
+		endpoint.URL = *req.URL
+	}
+	if req.Secret != nil {
+		if *req.Secret == "" {
+			return fmt.Errorf("%w: secret cannot be empty", ErrInvalidWebhook)
+		}
+		endpoint.Secret = *req.Secret
+	}
+	if req.MaxAttempts != nil {
+		endpoint.MaxAttempts = *req.MaxAttempts
+	}
+	if req.Enabled != nil {
+		endpoint.Enabled = *req.Enabled
+	}
+	if req.Events != nil || req.Filters != nil {
+		current := endpoint.Response()
+		events, filters := current.Events, current.Filters
+		if req.Events != nil {
+			events = *req.Events
+		}
+		if req.Filters != nil {
+			filters = *req.Filters
+		}
+		if err := ApplyWebhookSubscription(endpoint, events, filters); err != nil {
+			return err
+		}
+	}
+	return validateWebhookEndpoint(endpoint)
+}
+
+// ApplyWebhookSubscription validates and stores the events and filters of an endpoint
+func ApplyWebhookSubscription(endpoint *model.WebhookEndpoint, events []model.EventType, filters map[string][]string) error {
+	if len(events) == 0 {
+		return fmt.Errorf("%w: at least one event is required", ErrInvalidWebhook)
+	}
+	for _, event := range events {
+		if !model.IsKnownEvent(event) || event == model.EventWebhookPing {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+	}
+	for attr, values := range filters {
+		if attr == "" || len(values) == 0 {
+			return fmt.Errorf("%w: filter %q needs at least one value", ErrInvalidWebhook, attr)
+		}
+	}
+	eventsJSON, _ := json.Marshal(events)
+	endpoint.Events = string(eventsJSON)
+	if len(filters) == 0 {
+		endpoint.Filters = ""
+	} else {
+		filtersJSON, _ := json.Marshal(filters)
+		endpoint.Filters = string(filtersJSON)
+	}
+	return nil
+}
+
+func validateWebhookEndpoint(endpoint *model.WebhookEndpoint) error {
+	if endpoint.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidWebhook)
+	}
+	u, err := url.Parse(endpoint.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an http or https URL", ErrInvalidWebhook)
+	}
+	if endpoint.MaxAttempts == 0 {
+		endpoint.MaxAttempts = defaultWebhookRetries
+	}
+	if endpoint.MaxAttempts < 1 || endpoint.MaxAttempts > maxWebhookRetries {
+		return fmt.Errorf("%w: maxAttempts must be between 1 and %d", ErrInvalidWebhook, maxWebhookRetries)
+	}
+	return nil
+}
+
+func subscribes(events []model.EventType, eventType model.EventType) bool {
+	for _, e := range events {
+		if e == eventType || e == model.EventAll {
+			return true
+		}
+	}
+	return false
+}
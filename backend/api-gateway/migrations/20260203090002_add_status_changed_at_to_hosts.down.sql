@@ -0,0 +1,3 @@
+-- Remove status_changed_at column from hosts table
+ALTER TABLE hosts DROP COLUMN IF EXISTS status_changed_at;
+COMMENT ON COLUMN hosts.status IS 'Host status: pending, approved, rejected, offline, online';
@@ -0,0 +1,3 @@
+-- Add status_changed_at column to hosts table for heartbeat status transitions
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP;
+COMMENT ON COLUMN hosts.status IS 'Host status: pending, approved, rejected, online, degraded, offline';
@@ -0,0 +1,14 @@
+ALTER TABLE IF EXISTS grafana_dashboards DROP CONSTRAINT IF EXISTS fk_grafana_dashboards_instance_id;
+ALTER TABLE IF EXISTS grafana_data_sources DROP CONSTRAINT IF EXISTS fk_grafana_data_sources_instance_id;
+ALTER TABLE IF EXISTS grafana_folders DROP CONSTRAINT IF EXISTS fk_grafana_folders_instance_id;
+ALTER TABLE IF EXISTS k8s_cluster_nodes DROP CONSTRAINT IF EXISTS fk_k8s_cluster_nodes_cluster_id;
+ALTER TABLE IF EXISTS k8s_namespaces DROP CONSTRAINT IF EXISTS fk_k8s_namespaces_cluster_id;
+ALTER TABLE IF EXISTS alerts DROP CONSTRAINT IF EXISTS fk_alerts_rule_id;
+ALTER TABLE IF EXISTS role_permissions DROP CONSTRAINT IF EXISTS fk_role_permissions_role_id;
+ALTER TABLE IF EXISTS user_roles DROP CONSTRAINT IF EXISTS fk_user_roles_role_id;
+ALTER TABLE IF EXISTS llm_messages DROP CONSTRAINT IF EXISTS fk_llm_messages_conversation_id;
+ALTER TABLE IF EXISTS llm_context_snapshots DROP CONSTRAINT IF EXISTS fk_llm_context_snapshots_conversation_id;
+ALTER TABLE IF EXISTS llm_tool_invocations DROP CONSTRAINT IF EXISTS fk_llm_tool_invocations_conversation_id;
+ALTER TABLE IF EXISTS webhook_deliveries DROP CONSTRAINT IF EXISTS fk_webhook_deliveries_endpoint_id;
+ALTER TABLE IF EXISTS batch_task_hosts DROP CONSTRAINT IF EXISTS fk_batch_task_hosts_batch_task_id;
+ALTER TABLE IF EXISTS file_distributions DROP CONSTRAINT IF EXISTS fk_file_distributions_batch_task_id;
@@ -0,0 +1,40 @@
+-- Cascade deletes from parent records to the rows that belong to them, so a
+-- removed instance, cluster, rule, role, conversation, endpoint or batch task
+-- cannot leave orphans behind. Tables that do not exist yet when this runs are
+-- skipped.
+DO $$
+DECLARE
+    fk RECORD;
+BEGIN
+    FOR fk IN
+        SELECT * FROM (VALUES
+            ('grafana_dashboards',    'instance_id',     'grafana_instances'),
+            ('grafana_data_sources',  'instance_id',     'grafana_instances'),
+            ('grafana_folders',       'instance_id',     'grafana_instances'),
+            ('k8s_cluster_nodes',     'cluster_id',      'k8s_clusters'),
+            ('k8s_namespaces',        'cluster_id',      'k8s_clusters'),
+            ('alerts',                'rule_id',         'alert_rules'),
+            ('role_permissions',      'role_id',         'roles'),
+            ('user_roles',            'role_id',         'roles'),
+            ('llm_messages',          'conversation_id', 'llm_conversations'),
+            ('llm_context_snapshots', 'conversation_id', 'llm_conversations'),
+            ('llm_tool_invocations',  'conversation_id', 'llm_conversations'),
+            ('webhook_deliveries',    'endpoint_id',     'webhook_endpoints'),
+            ('batch_task_hosts',      'batch_task_id',   'batch_tasks'),
+            ('file_distributions',    'batch_task_id',   'batch_tasks')
+        ) AS t(child, col, parent)
+    LOOP
+        IF to_regclass(fk.child) IS NULL OR to_regclass(fk.parent) IS NULL THEN
+            CONTINUE;
+        END IF;
+        IF EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_' || fk.child || '_' || fk.col) THEN
+            CONTINUE;
+        END IF;
+
+        -- Rows left behind by earlier non-transactional deletes would fail the constraint
+        EXECUTE format('DELETE FROM %I c WHERE NOT EXISTS (SELECT 1 FROM %I p WHERE p.id = c.%I)',
+            fk.child, fk.parent, fk.col);
+        EXECUTE format('ALTER TABLE %I ADD CONSTRAINT %I FOREIGN KEY (%I) REFERENCES %I(id) ON DELETE CASCADE',
+            fk.child, 'fk_' || fk.child || '_' || fk.col, fk.col, fk.parent);
+    END LOOP;
+END $$;
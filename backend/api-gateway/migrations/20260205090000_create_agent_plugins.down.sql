@@ -0,0 +1,4 @@
+-- Drop agent plugin tables
+DROP TABLE IF EXISTS host_plugin_data;
+DROP INDEX IF EXISTS idx_agent_plugins_name;
+DROP TABLE IF EXISTS agent_plugins;
@@ -0,0 +1,33 @@
+-- Custom collectors run by host agents
+CREATE TABLE IF NOT EXISTS agent_plugins (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(63) NOT NULL,
+    description TEXT,
+    command VARCHAR(255) NOT NULL,
+    args TEXT[] NOT NULL DEFAULT '{}',
+    env JSONB NOT NULL DEFAULT '{}',
+    interval INTEGER NOT NULL DEFAULT 60,
+    timeout INTEGER NOT NULL DEFAULT 10,
+    host_tags TEXT[] NOT NULL DEFAULT '{}',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_agent_plugins_name ON agent_plugins(name);
+
+-- Latest data each plugin reported for a host
+CREATE TABLE IF NOT EXISTS host_plugin_data (
+    host_id UUID NOT NULL REFERENCES hosts(id) ON DELETE CASCADE,
+    plugin VARCHAR(63) NOT NULL,
+    data JSONB,
+    error TEXT,
+    collected_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (host_id, plugin)
+);
+
+COMMENT ON TABLE agent_plugins IS 'Custom collectors run by host agents on a schedule';
+COMMENT ON TABLE host_plugin_data IS 'Latest output of each agent plugin per host';
+COMMENT ON COLUMN agent_plugins.host_tags IS 'Runs on hosts with any of these tags, or on all hosts when empty';
@@ -0,0 +1,9 @@
+-- Drop host anomaly detection
+DROP INDEX IF EXISTS idx_anomaly_event_host_id;
+ALTER TABLE IF EXISTS anomaly_events DROP COLUMN IF EXISTS host_id;
+ALTER TABLE IF EXISTS anomaly_detection_rules
+    DROP COLUMN IF EXISTS host_tags,
+    DROP COLUMN IF EXISTS host_metric,
+    DROP COLUMN IF EXISTS source_type;
+DROP INDEX IF EXISTS idx_host_metrics_time;
+DROP TABLE IF EXISTS host_metrics;
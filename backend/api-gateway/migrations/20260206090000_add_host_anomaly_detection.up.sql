@@ -0,0 +1,31 @@
+-- Metric history reported by host agents
+CREATE TABLE IF NOT EXISTS host_metrics (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    host_id UUID NOT NULL REFERENCES hosts(id) ON DELETE CASCADE,
+    timestamp BIGINT NOT NULL,
+    cpu_usage_percent DOUBLE PRECISION NOT NULL DEFAULT 0,
+    load1 DOUBLE PRECISION NOT NULL DEFAULT 0,
+    load5 DOUBLE PRECISION NOT NULL DEFAULT 0,
+    load15 DOUBLE PRECISION NOT NULL DEFAULT 0,
+    memory_used_bytes BIGINT NOT NULL DEFAULT 0,
+    memory_available_bytes BIGINT NOT NULL DEFAULT 0,
+    swap_used_bytes BIGINT NOT NULL DEFAULT 0,
+    disk_usage_percent DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_host_metrics_time ON host_metrics(host_id, timestamp);
+
+-- Anomaly rules evaluated on host metrics
+ALTER TABLE IF EXISTS anomaly_detection_rules
+    ADD COLUMN IF NOT EXISTS source_type VARCHAR(20) NOT NULL DEFAULT 'prometheus',
+    ADD COLUMN IF NOT EXISTS host_metric VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS host_tags TEXT[] DEFAULT '{}';
+
+ALTER TABLE IF EXISTS anomaly_events
+    ADD COLUMN IF NOT EXISTS host_id UUID REFERENCES hosts(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_anomaly_event_host_id ON anomaly_events(host_id);
+
+COMMENT ON TABLE host_metrics IS 'Utilization samples reported by host agents, kept for metrics.retention';
+COMMENT ON COLUMN anomaly_detection_rules.host_tags IS 'Evaluated on hosts with any of these tags, or on all hosts when empty';
@@ -0,0 +1,3 @@
+-- Drop runbook tables
+DROP TABLE IF EXISTS runbook_executions;
+DROP TABLE IF EXISTS runbooks;
@@ -0,0 +1,49 @@
+-- Remediations attached to alert rules
+CREATE TABLE IF NOT EXISTS runbooks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rule_id UUID NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    action VARCHAR(30) NOT NULL,
+    trigger VARCHAR(20) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    task_template_id UUID REFERENCES batch_tasks(id) ON DELETE SET NULL,
+    alert_host_only BOOLEAN NOT NULL DEFAULT FALSE,
+    cluster_id UUID REFERENCES k8s_clusters(id) ON DELETE CASCADE,
+    namespace VARCHAR(253),
+    deployment VARCHAR(253),
+    scale_by INTEGER NOT NULL DEFAULT 0,
+    max_replicas INTEGER NOT NULL DEFAULT 0,
+    cooldown INTEGER NOT NULL DEFAULT 600,
+    max_per_hour INTEGER NOT NULL DEFAULT 3,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_runbooks_user_id ON runbooks(user_id);
+CREATE INDEX IF NOT EXISTS idx_runbooks_rule_id ON runbooks(rule_id);
+
+-- Runs of runbooks, and runs held back by their guardrails
+CREATE TABLE IF NOT EXISTS runbook_executions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    runbook_id UUID NOT NULL REFERENCES runbooks(id) ON DELETE CASCADE,
+    rule_id UUID NOT NULL,
+    alert_id UUID NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    trigger VARCHAR(20) NOT NULL,
+    triggered_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL,
+    message TEXT,
+    batch_task_id UUID REFERENCES batch_tasks(id) ON DELETE SET NULL,
+    started_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_runbook_executions_runbook ON runbook_executions(runbook_id, started_at);
+CREATE INDEX IF NOT EXISTS idx_runbook_executions_alert_id ON runbook_executions(alert_id);
+CREATE INDEX IF NOT EXISTS idx_runbook_executions_user_id ON runbook_executions(user_id);
+
+COMMENT ON TABLE runbooks IS 'Batch task or Kubernetes remediations run for alerts of a rule, automatically or on request';
+COMMENT ON COLUMN runbooks.max_per_hour IS 'Runs allowed per hour, or no limit when 0';
+COMMENT ON COLUMN runbook_executions.status IS 'running, succeeded, failed, or skipped when held back by a guardrail';
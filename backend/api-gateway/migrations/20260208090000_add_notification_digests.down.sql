@@ -0,0 +1,8 @@
+-- Drop notification digests
+DROP TABLE IF EXISTS notification_digest_items;
+
+ALTER TABLE IF EXISTS notification_preferences
+    DROP COLUMN IF EXISTS web_digest,
+    DROP COLUMN IF EXISTS email_digest,
+    DROP COLUMN IF EXISTS digest_hour,
+    DROP COLUMN IF EXISTS immediate_priority;
@@ -0,0 +1,23 @@
+-- Digest settings of notification preferences
+ALTER TABLE IF EXISTS notification_preferences
+    ADD COLUMN IF NOT EXISTS web_digest VARCHAR(10) NOT NULL DEFAULT 'off',
+    ADD COLUMN IF NOT EXISTS email_digest VARCHAR(10) NOT NULL DEFAULT 'off',
+    ADD COLUMN IF NOT EXISTS digest_hour INT NOT NULL DEFAULT 9,
+    ADD COLUMN IF NOT EXISTS immediate_priority VARCHAR(20) NOT NULL DEFAULT 'critical';
+
+-- Notifications waiting for a digest or the end of quiet hours
+CREATE TABLE IF NOT EXISTS notification_digest_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    notification_id UUID NOT NULL,
+    immediate BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_digest_due ON notification_digest_items(user_id, channel);
+CREATE INDEX IF NOT EXISTS idx_notification_digest_items_notification_id ON notification_digest_items(notification_id);
+
+COMMENT ON TABLE notification_digest_items IS 'Notifications queued per channel until their digest is due and quiet hours are over';
+COMMENT ON COLUMN notification_digest_items.immediate IS 'Email at or above the immediate priority, sent on the next pass';
+COMMENT ON COLUMN notification_preferences.digest_hour IS 'Local hour, in the preference timezone, of daily digests';
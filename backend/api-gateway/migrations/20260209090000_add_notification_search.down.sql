@@ -0,0 +1,9 @@
+-- Drop notification search and archiving
+DROP INDEX IF EXISTS idx_notifications_search;
+DROP INDEX IF EXISTS idx_notifications_user_page;
+DROP INDEX IF EXISTS idx_notifications_source;
+
+ALTER TABLE IF EXISTS notifications
+    DROP COLUMN IF EXISTS source,
+    DROP COLUMN IF EXISTS archived,
+    DROP COLUMN IF EXISTS archived_at;
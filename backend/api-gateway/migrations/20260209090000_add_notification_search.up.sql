@@ -0,0 +1,17 @@
+-- Source module and archiving of notifications
+ALTER TABLE IF EXISTS notifications
+    ADD COLUMN IF NOT EXISTS source VARCHAR(30) NOT NULL DEFAULT 'system',
+    ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+
+-- Existing alert and task notifications come from those modules
+UPDATE notifications SET source = 'alerts' WHERE type = 'alert' AND source = 'system';
+UPDATE notifications SET source = 'batch_tasks' WHERE type = 'task' AND source = 'system';
+
+CREATE INDEX IF NOT EXISTS idx_notifications_source ON notifications(source);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_page ON notifications(user_id, archived, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_search ON notifications
+    USING GIN (to_tsvector('simple', title || ' ' || coalesce(message, '')));
+
+COMMENT ON COLUMN notifications.source IS 'Module the notification comes from: alerts, batch_tasks, ai, hosts, clusters or system';
+COMMENT ON COLUMN notifications.archived IS 'Archived notifications are left out of the notification list and unread count';
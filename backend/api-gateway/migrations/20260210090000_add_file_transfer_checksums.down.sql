@@ -0,0 +1,3 @@
+-- Drop file transfer checksums
+ALTER TABLE IF EXISTS file_transfers
+    DROP COLUMN IF EXISTS checksum;
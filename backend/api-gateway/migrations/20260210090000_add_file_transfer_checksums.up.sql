@@ -0,0 +1,5 @@
+-- Checksums of transferred files
+ALTER TABLE IF EXISTS file_transfers
+    ADD COLUMN IF NOT EXISTS checksum VARCHAR(64);
+
+COMMENT ON COLUMN file_transfers.checksum IS 'SHA-256 of the file content, recorded when the transfer completes';
@@ -0,0 +1,2 @@
+-- Drop long-running operations
+DROP TABLE IF EXISTS operations;
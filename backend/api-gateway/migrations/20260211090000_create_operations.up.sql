@@ -0,0 +1,31 @@
+-- Long-running operations started by API requests
+CREATE TABLE IF NOT EXISTS operations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    progress INT NOT NULL DEFAULT 0,
+    message TEXT,
+    resource_type VARCHAR(50),
+    resource_id UUID,
+    result JSONB,
+    error TEXT,
+    cancellable BOOLEAN NOT NULL DEFAULT false,
+    cancel_requested BOOLEAN NOT NULL DEFAULT false,
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    heartbeat_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_operations_user_id ON operations(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_operations_type ON operations(type);
+CREATE INDEX IF NOT EXISTS idx_operations_status ON operations(status);
+CREATE INDEX IF NOT EXISTS idx_operations_resource_id ON operations(resource_id);
+CREATE INDEX IF NOT EXISTS idx_operations_heartbeat_at ON operations(heartbeat_at) WHERE status IN ('pending', 'running');
+
+COMMENT ON TABLE operations IS 'Work that outlives the request starting it: host scans, batch task runs, Grafana syncs';
+COMMENT ON COLUMN operations.progress IS 'Percent done, 0 to 100; 100 only once the operation succeeded';
+COMMENT ON COLUMN operations.heartbeat_at IS 'Refreshed by the instance running the operation; running operations that stop heartbeating are failed';
+COMMENT ON COLUMN operations.cancel_requested IS 'Set by a cancel request, picked up by the running instance on its next heartbeat';
@@ -0,0 +1,2 @@
+-- Drop the background job queue
+DROP TABLE IF EXISTS jobs;
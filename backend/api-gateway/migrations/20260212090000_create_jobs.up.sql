@@ -0,0 +1,28 @@
+-- Background job queue shared by the gateway instances
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    type VARCHAR(100) NOT NULL,
+    priority INT NOT NULL DEFAULT 0,
+    payload JSONB,
+    status VARCHAR(20) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL,
+    run_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMP,
+    locked_by VARCHAR(100),
+    last_error TEXT,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    completed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs(priority DESC, run_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_jobs_locked_until ON jobs(locked_until) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS idx_jobs_type_status ON jobs(type, status);
+CREATE INDEX IF NOT EXISTS idx_jobs_completed_at ON jobs(completed_at) WHERE status = 'succeeded';
+
+COMMENT ON TABLE jobs IS 'Background work claimed by the first free worker of any gateway instance';
+COMMENT ON COLUMN jobs.priority IS 'Due jobs with a higher priority are claimed first';
+COMMENT ON COLUMN jobs.locked_until IS 'End of the running attempt''s visibility timeout; expired running jobs are claimed again';
+COMMENT ON COLUMN jobs.status IS 'queued, running, succeeded, or dead once out of attempts';
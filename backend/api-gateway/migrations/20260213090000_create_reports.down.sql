@@ -0,0 +1,3 @@
+-- Drop scheduled reports and the report archive
+DROP TABLE IF EXISTS reports;
+DROP TABLE IF EXISTS report_schedules;
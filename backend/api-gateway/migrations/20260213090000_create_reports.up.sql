@@ -0,0 +1,43 @@
+-- Scheduled reports and the archive of generated reports
+CREATE TABLE IF NOT EXISTS report_schedules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    template VARCHAR(50) NOT NULL,
+    format VARCHAR(10) NOT NULL,
+    schedule VARCHAR(100) NOT NULL,
+    window_seconds INT NOT NULL,
+    recipients JSONB,
+    enabled BOOLEAN DEFAULT TRUE,
+    created_by UUID NOT NULL,
+    last_run_at TIMESTAMP,
+    next_run_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_report_schedules_next_run_at ON report_schedules(next_run_at) WHERE enabled;
+
+CREATE TABLE IF NOT EXISTS reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    schedule_id UUID,
+    triggered_by UUID,
+    title VARCHAR(255) NOT NULL,
+    template VARCHAR(50) NOT NULL,
+    format VARCHAR(10) NOT NULL,
+    recipients JSONB,
+    period_start TIMESTAMP NOT NULL,
+    period_end TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    data JSONB,
+    error TEXT,
+    completed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reports_schedule_id ON reports(schedule_id);
+CREATE INDEX IF NOT EXISTS idx_reports_created_at ON reports(created_at);
+
+COMMENT ON COLUMN report_schedules.schedule IS 'crontab(5) schedule the report is generated on';
+COMMENT ON COLUMN report_schedules.window_seconds IS 'Seconds before the scheduled time each report covers';
+COMMENT ON COLUMN report_schedules.next_run_at IS 'Next scheduled time; NULL while the schedule is disabled';
+COMMENT ON COLUMN reports.data IS 'What the report found, rendered to PDF or CSV on download';
@@ -0,0 +1,4 @@
+-- Drop service level objectives and the alert rules they manage
+DELETE FROM alerts WHERE rule_id IN (SELECT id FROM alert_rules WHERE metric_type = 'slo_burn_rate');
+DELETE FROM alert_rules WHERE metric_type = 'slo_burn_rate';
+DROP TABLE IF EXISTS slos;
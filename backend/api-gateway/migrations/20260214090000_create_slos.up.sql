@@ -0,0 +1,31 @@
+-- Service level objectives evaluated against Prometheus data sources
+CREATE TABLE IF NOT EXISTS slos (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    data_source_id UUID NOT NULL,
+    good_query TEXT NOT NULL,
+    total_query TEXT NOT NULL,
+    objective DOUBLE PRECISION NOT NULL,
+    window_seconds INT NOT NULL,
+    burn_rate_alerts JSONB,
+    enabled BOOLEAN DEFAULT TRUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    sli DOUBLE PRECISION,
+    error_budget_remaining DOUBLE PRECISION,
+    last_evaluated_at TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_slos_user_id ON slos(user_id);
+CREATE INDEX IF NOT EXISTS idx_slos_data_source_id ON slos(data_source_id);
+CREATE INDEX IF NOT EXISTS idx_slos_last_evaluated_at ON slos(last_evaluated_at) WHERE enabled;
+
+COMMENT ON COLUMN slos.good_query IS 'PromQL count of good events over $window';
+COMMENT ON COLUMN slos.total_query IS 'PromQL count of all events over $window';
+COMMENT ON COLUMN slos.objective IS 'Target percentage of good events, e.g. 99.9';
+COMMENT ON COLUMN slos.burn_rate_alerts IS 'Multi-window burn-rate alerts and the alert rules they fire through';
+COMMENT ON COLUMN slos.error_budget_remaining IS 'Percent of the error budget left over the window; negative when overspent';
@@ -0,0 +1,5 @@
+-- Drop synthetic checks, their results and the alert rules they manage
+DELETE FROM alerts WHERE rule_id IN (SELECT id FROM alert_rules WHERE metric_type = 'synthetic_failures');
+DELETE FROM alert_rules WHERE metric_type = 'synthetic_failures';
+DROP TABLE IF EXISTS synthetic_results;
+DROP TABLE IF EXISTS synthetic_checks;
@@ -0,0 +1,49 @@
+-- Synthetic checks probed on an interval from the gateway and host agents
+CREATE TABLE IF NOT EXISTS synthetic_checks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(10) NOT NULL,
+    target VARCHAR(2048) NOT NULL,
+    method VARCHAR(10),
+    interval INT NOT NULL,
+    timeout INT NOT NULL,
+    locations JSONB,
+    expected_status VARCHAR(100),
+    body_regex TEXT,
+    max_latency INT DEFAULT 0,
+    failure_threshold INT NOT NULL DEFAULT 1,
+    severity VARCHAR(20) NOT NULL,
+    alert_rule_id UUID,
+    enabled BOOLEAN DEFAULT TRUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    failing_count INT DEFAULT 0,
+    last_latency BIGINT,
+    last_error TEXT,
+    last_checked_at TIMESTAMP,
+    next_run_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_synthetic_checks_user_id ON synthetic_checks(user_id);
+CREATE INDEX IF NOT EXISTS idx_synthetic_checks_next_run_at ON synthetic_checks(next_run_at) WHERE enabled;
+
+CREATE TABLE IF NOT EXISTS synthetic_results (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    check_id UUID NOT NULL REFERENCES synthetic_checks(id) ON DELETE CASCADE,
+    location VARCHAR(64) NOT NULL,
+    success BOOLEAN NOT NULL,
+    latency BIGINT NOT NULL DEFAULT 0,
+    status_code INT,
+    error TEXT,
+    checked_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_synthetic_results_check_time ON synthetic_results(check_id, checked_at);
+CREATE INDEX IF NOT EXISTS idx_synthetic_results_checked_at ON synthetic_results(checked_at);
+
+COMMENT ON COLUMN synthetic_checks.locations IS 'JSON array of locations: gateway or host IDs whose agents run the probe';
+COMMENT ON COLUMN synthetic_checks.expected_status IS 'HTTP status codes and ranges, e.g. 200-299,301; 2xx and 3xx when empty';
+COMMENT ON COLUMN synthetic_checks.failure_threshold IS 'Failing locations that make the check down and fire its alert rule';
+COMMENT ON COLUMN synthetic_results.checked_at IS 'Shared by the results of one run across locations';
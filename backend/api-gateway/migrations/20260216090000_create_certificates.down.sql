@@ -0,0 +1,2 @@
+-- Drop the certificate inventory
+DROP TABLE IF EXISTS certificates;
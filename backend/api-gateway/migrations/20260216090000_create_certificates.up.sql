@@ -0,0 +1,43 @@
+-- Inventory of TLS certificates monitored for expiry
+CREATE TABLE IF NOT EXISTS certificates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source VARCHAR(20) NOT NULL,
+    key VARCHAR(1024) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    host VARCHAR(255),
+    port INT,
+    server_name VARCHAR(255),
+    cluster_id UUID REFERENCES k8s_clusters(id) ON DELETE CASCADE,
+    namespace VARCHAR(255),
+    resource VARCHAR(255),
+    subject TEXT,
+    issuer TEXT,
+    dns_names TEXT,
+    serial VARCHAR(100),
+    fingerprint VARCHAR(64),
+    not_before TIMESTAMP,
+    not_after TIMESTAMP,
+    verify_error TEXT,
+    warning_days INT DEFAULT 0,
+    critical_days INT DEFAULT 0,
+    enabled BOOLEAN DEFAULT TRUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    notified_level VARCHAR(20),
+    last_error TEXT,
+    last_checked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_certificates_user_key ON certificates(user_id, key);
+CREATE INDEX IF NOT EXISTS idx_certificates_source ON certificates(source);
+CREATE INDEX IF NOT EXISTS idx_certificates_cluster_id ON certificates(cluster_id);
+CREATE INDEX IF NOT EXISTS idx_certificates_not_after ON certificates(not_after);
+CREATE INDEX IF NOT EXISTS idx_certificates_status ON certificates(status);
+
+COMMENT ON COLUMN certificates.source IS 'endpoint (added by the user), ingress or kubeconfig (discovered from clusters)';
+COMMENT ON COLUMN certificates.key IS 'Identifies the certificate among the user''s, e.g. ingress/<cluster>/<namespace>/<ingress>/<secret>';
+COMMENT ON COLUMN certificates.warning_days IS 'Days before expiry the owner is first warned; 0 uses certificates.expiry_warning';
+COMMENT ON COLUMN certificates.critical_days IS 'Days before expiry the certificate is critical; 0 uses certificates.expiry_critical';
+COMMENT ON COLUMN certificates.notified_level IS 'Last status the owner was notified of';
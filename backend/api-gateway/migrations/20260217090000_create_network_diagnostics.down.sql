@@ -0,0 +1,2 @@
+-- Drop the network diagnostic history
+DROP TABLE IF EXISTS network_diagnostics;
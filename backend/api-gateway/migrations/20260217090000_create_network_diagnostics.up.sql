@@ -0,0 +1,34 @@
+-- History of network diagnostics run from host agents
+CREATE TABLE IF NOT EXISTS network_diagnostics (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    host_id UUID NOT NULL REFERENCES hosts(id) ON DELETE CASCADE,
+    host_name VARCHAR(255),
+    type VARCHAR(20) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    peer_host_id UUID REFERENCES hosts(id) ON DELETE SET NULL,
+    peer_host_name VARCHAR(255),
+    options JSONB,
+    status VARCHAR(20) NOT NULL,
+    summary VARCHAR(255),
+    result JSONB,
+    error TEXT,
+    operation_id UUID,
+    duration BIGINT DEFAULT 0,
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_network_diagnostics_user_id ON network_diagnostics(user_id);
+CREATE INDEX IF NOT EXISTS idx_network_diagnostics_host_id ON network_diagnostics(host_id);
+CREATE INDEX IF NOT EXISTS idx_network_diagnostics_peer_host_id ON network_diagnostics(peer_host_id);
+CREATE INDEX IF NOT EXISTS idx_network_diagnostics_type ON network_diagnostics(type);
+CREATE INDEX IF NOT EXISTS idx_network_diagnostics_status ON network_diagnostics(status);
+CREATE INDEX IF NOT EXISTS idx_network_diagnostics_created_at ON network_diagnostics(created_at);
+
+COMMENT ON COLUMN network_diagnostics.type IS 'dns, traceroute, mtr, tcp or bandwidth';
+COMMENT ON COLUMN network_diagnostics.target IS 'Name, host or host:port tested; the peer''s address for bandwidth tests';
+COMMENT ON COLUMN network_diagnostics.options IS 'Test options sent to the agent';
+COMMENT ON COLUMN network_diagnostics.status IS 'running, completed (the agent ran the test) or failed (the test could not be run)';
+COMMENT ON COLUMN network_diagnostics.duration IS 'Milliseconds the test took';
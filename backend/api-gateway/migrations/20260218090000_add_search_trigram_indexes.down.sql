@@ -0,0 +1,6 @@
+-- Drop the global search trigram indexes
+DROP INDEX IF EXISTS idx_hosts_hostname_trgm;
+DROP INDEX IF EXISTS idx_hosts_ip_address_trgm;
+DROP INDEX IF EXISTS idx_helm_releases_name_trgm;
+DROP INDEX IF EXISTS idx_grafana_dashboards_title_trgm;
+DROP INDEX IF EXISTS idx_alert_rules_name_trgm;
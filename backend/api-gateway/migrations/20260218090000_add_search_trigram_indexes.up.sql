@@ -0,0 +1,24 @@
+-- Trigram indexes keep the substring matches of the global search fast. Tables
+-- that do not exist yet when this runs are skipped.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+DO $$
+DECLARE
+    idx RECORD;
+BEGIN
+    FOR idx IN
+        SELECT * FROM (VALUES
+            ('idx_hosts_hostname_trgm',            'hosts',              'hostname'),
+            ('idx_hosts_ip_address_trgm',          'hosts',              'host(ip_address)'),
+            ('idx_helm_releases_name_trgm',        'helm_releases',      'name'),
+            ('idx_grafana_dashboards_title_trgm',  'grafana_dashboards', 'title'),
+            ('idx_alert_rules_name_trgm',          'alert_rules',        'name')
+        ) AS t(name, tbl, expr)
+    LOOP
+        IF to_regclass(idx.tbl) IS NULL THEN
+            CONTINUE;
+        END IF;
+        EXECUTE format('CREATE INDEX IF NOT EXISTS %I ON %I USING GIN ((%s) gin_trgm_ops)',
+            idx.name, idx.tbl, idx.expr);
+    END LOOP;
+END $$;
@@ -0,0 +1,15 @@
+-- Drop the resource tags and the triggers that clean them up
+DO $$
+DECLARE
+    tbl TEXT;
+BEGIN
+    FOREACH tbl IN ARRAY ARRAY['k8s_clusters', 'prometheus_data_sources', 'grafana_dashboards', 'alert_rules', 'helm_releases']
+    LOOP
+        IF to_regclass(tbl) IS NOT NULL THEN
+            EXECUTE format('DROP TRIGGER IF EXISTS trg_%s_delete_tags ON %I', tbl, tbl);
+        END IF;
+    END LOOP;
+END $$;
+
+DROP FUNCTION IF EXISTS delete_resource_tags();
+DROP TABLE IF EXISTS resource_tags;
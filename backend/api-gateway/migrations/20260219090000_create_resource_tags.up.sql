@@ -0,0 +1,49 @@
+-- Key=value tags on clusters, data sources, dashboards, alert rules and Helm
+-- releases, used to filter lists and by the selectors of access policies
+CREATE TABLE IF NOT EXISTS resource_tags (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    resource_type VARCHAR(32) NOT NULL,
+    resource_id UUID NOT NULL,
+    key VARCHAR(317) NOT NULL,
+    value VARCHAR(63) NOT NULL DEFAULT '',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_resource_tags_resource_key ON resource_tags(resource_type, resource_id, key);
+CREATE INDEX IF NOT EXISTS idx_resource_tags_key_value ON resource_tags(resource_type, key, value);
+
+COMMENT ON COLUMN resource_tags.resource_type IS 'cluster, data_source, dashboard, alert_rule or helm_release';
+COMMENT ON COLUMN resource_tags.key IS 'Kubernetes label key, optionally with a DNS prefix';
+
+-- Deleting a resource, including through a cascade, deletes its tags. Tables
+-- that do not exist yet when this runs are skipped.
+CREATE OR REPLACE FUNCTION delete_resource_tags() RETURNS TRIGGER AS $$
+BEGIN
+    DELETE FROM resource_tags WHERE resource_type = TG_ARGV[0] AND resource_id = OLD.id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DO $$
+DECLARE
+    t RECORD;
+BEGIN
+    FOR t IN
+        SELECT * FROM (VALUES
+            ('k8s_clusters',            'cluster'),
+            ('prometheus_data_sources', 'data_source'),
+            ('grafana_dashboards',      'dashboard'),
+            ('alert_rules',             'alert_rule'),
+            ('helm_releases',           'helm_release')
+        ) AS v(tbl, resource_type)
+    LOOP
+        IF to_regclass(t.tbl) IS NULL THEN
+            CONTINUE;
+        END IF;
+        EXECUTE format('DROP TRIGGER IF EXISTS trg_%s_delete_tags ON %I', t.tbl, t.tbl);
+        EXECUTE format('CREATE TRIGGER trg_%s_delete_tags AFTER DELETE ON %I FOR EACH ROW EXECUTE FUNCTION delete_resource_tags(%L)',
+            t.tbl, t.tbl, t.resource_type);
+    END LOOP;
+END $$;
@@ -0,0 +1,2 @@
+-- Drop the cluster upgrade assessments
+DROP TABLE IF EXISTS cluster_upgrade_assessments;
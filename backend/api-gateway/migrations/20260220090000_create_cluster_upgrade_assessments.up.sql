@@ -0,0 +1,25 @@
+-- Deprecated API assessments of clusters ahead of a Kubernetes upgrade
+CREATE TABLE IF NOT EXISTS cluster_upgrade_assessments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    cluster_id UUID NOT NULL REFERENCES k8s_clusters(id) ON DELETE CASCADE,
+    cluster_name VARCHAR(255),
+    triggered_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    current_version VARCHAR(50),
+    target_version VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    critical INTEGER DEFAULT 0,
+    warnings INTEGER DEFAULT 0,
+    findings JSONB,
+    error TEXT,
+    completed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_cluster_upgrade_assessments_cluster_id ON cluster_upgrade_assessments(cluster_id);
+CREATE INDEX IF NOT EXISTS idx_cluster_upgrade_assessments_created_at ON cluster_upgrade_assessments(created_at);
+
+COMMENT ON COLUMN cluster_upgrade_assessments.target_version IS 'Kubernetes minor release assessed for, e.g. 1.29';
+COMMENT ON COLUMN cluster_upgrade_assessments.status IS 'pending (queued for the scan), completed or failed';
+COMMENT ON COLUMN cluster_upgrade_assessments.critical IS 'Findings whose API is removed by the target version';
+COMMENT ON COLUMN cluster_upgrade_assessments.warnings IS 'Findings whose API is deprecated by the target version and removed later';
+COMMENT ON COLUMN cluster_upgrade_assessments.findings IS 'Live objects and Helm release manifests using deprecated API versions';
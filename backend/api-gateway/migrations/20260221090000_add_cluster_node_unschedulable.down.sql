@@ -0,0 +1,3 @@
+-- Drop the cordon state of cluster nodes
+ALTER TABLE IF EXISTS k8s_cluster_nodes
+    DROP COLUMN IF EXISTS unschedulable;
@@ -0,0 +1,5 @@
+-- Cordon state of cluster nodes
+ALTER TABLE IF EXISTS k8s_cluster_nodes
+    ADD COLUMN IF NOT EXISTS unschedulable BOOLEAN NOT NULL DEFAULT false;
+
+COMMENT ON COLUMN k8s_cluster_nodes.unschedulable IS 'Cordoned: no new pods are scheduled on the node';
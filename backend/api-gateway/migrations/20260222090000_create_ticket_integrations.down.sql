@@ -0,0 +1,3 @@
+-- Drop ticketing integration tables
+DROP TABLE IF EXISTS alert_tickets;
+DROP TABLE IF EXISTS ticket_integrations;
@@ -0,0 +1,60 @@
+-- Jira and ServiceNow projects alerts open issues in
+CREATE TABLE IF NOT EXISTS ticket_integrations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    provider VARCHAR(20) NOT NULL,
+    base_url VARCHAR(2048) NOT NULL,
+    username VARCHAR(255),
+    token TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    project VARCHAR(255),
+    issue_type VARCHAR(255),
+    severities TEXT,
+    summary_template TEXT,
+    description_template TEXT,
+    fields TEXT,
+    resolve_transition VARCHAR(255),
+    sync_status BOOLEAN NOT NULL DEFAULT TRUE,
+    inbound_token_hash VARCHAR(64),
+    last_synced_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_integration_user_id ON ticket_integrations(user_id);
+CREATE INDEX IF NOT EXISTS idx_ticket_integrations_inbound_token_hash ON ticket_integrations(inbound_token_hash);
+
+COMMENT ON COLUMN ticket_integrations.provider IS 'jira or servicenow';
+COMMENT ON COLUMN ticket_integrations.project IS 'Jira project key, or ServiceNow assignment group';
+COMMENT ON COLUMN ticket_integrations.issue_type IS 'Jira issue type, or ServiceNow table (incident by default)';
+COMMENT ON COLUMN ticket_integrations.severities IS 'JSON array of the alert severities that open issues; every severity when empty';
+COMMENT ON COLUMN ticket_integrations.fields IS 'JSON object of provider field to Go template rendered over the alert';
+COMMENT ON COLUMN ticket_integrations.resolve_transition IS 'Jira transition name, or ServiceNow state, applied when the alert resolves';
+COMMENT ON COLUMN ticket_integrations.sync_status IS 'Resolve alerts whose issue is closed in the ticketing system';
+
+-- Issues opened for alerts
+CREATE TABLE IF NOT EXISTS alert_tickets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    alert_id UUID NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    integration_id UUID NOT NULL REFERENCES ticket_integrations(id) ON DELETE CASCADE,
+    provider VARCHAR(20) NOT NULL,
+    external_id VARCHAR(255) NOT NULL,
+    external_key VARCHAR(255) NOT NULL,
+    url VARCHAR(2048),
+    external_status VARCHAR(255),
+    status VARCHAR(20) NOT NULL,
+    last_synced_at TIMESTAMP,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alert_ticket_alert_integration ON alert_tickets(alert_id, integration_id);
+CREATE INDEX IF NOT EXISTS idx_alert_tickets_integration_id ON alert_tickets(integration_id);
+CREATE INDEX IF NOT EXISTS idx_alert_tickets_external_id ON alert_tickets(external_id);
+CREATE INDEX IF NOT EXISTS idx_alert_tickets_status ON alert_tickets(status);
+
+COMMENT ON COLUMN alert_tickets.external_id IS 'Jira issue ID, or ServiceNow sys_id';
+COMMENT ON COLUMN alert_tickets.external_key IS 'Jira issue key, or ServiceNow number';
+COMMENT ON COLUMN alert_tickets.status IS 'open, or resolved by the alert or in the ticketing system';
@@ -0,0 +1,7 @@
+-- Drop ChatOps integrations and alert acknowledgements
+ALTER TABLE IF EXISTS alerts
+    DROP COLUMN IF EXISTS acknowledged_by,
+    DROP COLUMN IF EXISTS acknowledged_at;
+
+DROP TABLE IF EXISTS chat_user_links;
+DROP TABLE IF EXISTS chatops_integrations;
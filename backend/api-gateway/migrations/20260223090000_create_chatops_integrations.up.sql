@@ -0,0 +1,45 @@
+-- Slack apps and Teams outgoing webhooks platform commands are run from
+CREATE TABLE IF NOT EXISTS chatops_integrations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    provider VARCHAR(20) NOT NULL,
+    team_id VARCHAR(255),
+    signing_secret TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    last_command_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_chatops_integration_user_id ON chatops_integrations(user_id);
+
+COMMENT ON COLUMN chatops_integrations.provider IS 'slack or teams';
+COMMENT ON COLUMN chatops_integrations.team_id IS 'Slack team ID or Teams tenant ID commands must come from; any when empty';
+COMMENT ON COLUMN chatops_integrations.signing_secret IS 'Slack signing secret, or Teams outgoing webhook security token';
+
+-- Chat users linked to the platform users their commands run as
+CREATE TABLE IF NOT EXISTS chat_user_links (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    integration_id UUID NOT NULL REFERENCES chatops_integrations(id) ON DELETE CASCADE,
+    external_user_id VARCHAR(255) NOT NULL,
+    external_name VARCHAR(255),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    link_code_hash VARCHAR(64),
+    link_code_expires_at TIMESTAMP,
+    linked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_user_link_integration_user ON chat_user_links(integration_id, external_user_id);
+CREATE INDEX IF NOT EXISTS idx_chat_user_links_user_id ON chat_user_links(user_id);
+CREATE INDEX IF NOT EXISTS idx_chat_user_links_link_code_hash ON chat_user_links(link_code_hash);
+
+COMMENT ON COLUMN chat_user_links.external_user_id IS 'Slack user ID, or Azure AD object ID in Teams';
+COMMENT ON COLUMN chat_user_links.user_id IS 'Platform user commands run as; empty until the link code is confirmed';
+
+-- Acknowledgement of alerts by whoever is handling them
+ALTER TABLE IF EXISTS alerts
+    ADD COLUMN IF NOT EXISTS acknowledged_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS acknowledged_by UUID;
@@ -0,0 +1,18 @@
+-- Drop the audit log chain and the protection of sealed records
+DO $$
+BEGIN
+    IF to_regclass('audit_logs') IS NOT NULL THEN
+        DROP TRIGGER IF EXISTS trg_audit_logs_protect_sealed ON audit_logs;
+    END IF;
+END $$;
+
+DROP TABLE IF EXISTS audit_checkpoints;
+DROP FUNCTION IF EXISTS protect_audit_checkpoints();
+DROP FUNCTION IF EXISTS protect_sealed_audit_logs();
+
+DROP INDEX IF EXISTS idx_audit_logs_unsealed;
+DROP INDEX IF EXISTS idx_audit_logs_sequence;
+ALTER TABLE IF EXISTS audit_logs
+    DROP COLUMN IF EXISTS hash,
+    DROP COLUMN IF EXISTS prev_hash,
+    DROP COLUMN IF EXISTS sequence;
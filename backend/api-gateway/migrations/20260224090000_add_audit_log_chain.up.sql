@@ -0,0 +1,61 @@
+-- Hash chain of audit records: each sealed record stores the hash of the one
+-- before it, so changed, removed or reordered records can be detected
+ALTER TABLE IF EXISTS audit_logs
+    ADD COLUMN IF NOT EXISTS sequence BIGINT,
+    ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS hash VARCHAR(64);
+
+CREATE TABLE IF NOT EXISTS audit_checkpoints (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    from_sequence BIGINT NOT NULL,
+    sequence BIGINT NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    export_target_id UUID,
+    export_key VARCHAR(1024),
+    exported_at TIMESTAMP,
+    export_error TEXT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_checkpoints_sequence ON audit_checkpoints(sequence);
+
+COMMENT ON TABLE audit_checkpoints IS 'Anchors of the audit log chain, each exported once to a backup target';
+COMMENT ON COLUMN audit_checkpoints.hash IS 'Hash of the audit record at sequence when the checkpoint was taken';
+
+-- Sealed audit records cannot be changed or deleted; unsealed ones can, so they
+-- can be sealed
+CREATE OR REPLACE FUNCTION protect_sealed_audit_logs() RETURNS TRIGGER AS $$
+BEGIN
+    IF OLD.sequence IS NOT NULL THEN
+        RAISE EXCEPTION 'audit log % is sealed and cannot be changed', OLD.id;
+    END IF;
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION protect_audit_checkpoints() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' OR NEW.sequence <> OLD.sequence OR NEW.hash <> OLD.hash OR NEW.from_sequence <> OLD.from_sequence THEN
+        RAISE EXCEPTION 'audit checkpoint % cannot be changed', OLD.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DO $$
+BEGIN
+    IF to_regclass('audit_logs') IS NOT NULL THEN
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_logs_sequence ON audit_logs(sequence);
+        CREATE INDEX IF NOT EXISTS idx_audit_logs_unsealed ON audit_logs(created_at) WHERE sequence IS NULL;
+        DROP TRIGGER IF EXISTS trg_audit_logs_protect_sealed ON audit_logs;
+        CREATE TRIGGER trg_audit_logs_protect_sealed BEFORE UPDATE OR DELETE ON audit_logs
+            FOR EACH ROW EXECUTE FUNCTION protect_sealed_audit_logs();
+    END IF;
+END $$;
+
+DROP TRIGGER IF EXISTS trg_audit_checkpoints_protect ON audit_checkpoints;
+CREATE TRIGGER trg_audit_checkpoints_protect BEFORE UPDATE OR DELETE ON audit_checkpoints
+    FOR EACH ROW EXECUTE FUNCTION protect_audit_checkpoints();
@@ -0,0 +1,2 @@
+-- Drop data exports and their files
+DROP TABLE IF EXISTS data_exports;
@@ -0,0 +1,27 @@
+-- Raw data exports of hosts, metrics and alerts, generated on the job queue
+CREATE TABLE IF NOT EXISTS data_exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    dataset VARCHAR(50) NOT NULL,
+    format VARCHAR(10) NOT NULL,
+    from_time TIMESTAMP,
+    to_time TIMESTAMP,
+    cluster_id UUID,
+    host_ids TEXT[],
+    status VARCHAR(20) NOT NULL,
+    rows BIGINT DEFAULT 0,
+    size_bytes BIGINT DEFAULT 0,
+    error TEXT,
+    data BYTEA,
+    secret VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_user_id ON data_exports(user_id);
+CREATE INDEX IF NOT EXISTS idx_data_exports_expires_at ON data_exports(expires_at);
+CREATE INDEX IF NOT EXISTS idx_data_exports_created_at ON data_exports(created_at);
+
+COMMENT ON COLUMN data_exports.data IS 'The CSV or Parquet file, deleted with the export once it expires';
+COMMENT ON COLUMN data_exports.secret IS 'Key the download links of the export are signed with';
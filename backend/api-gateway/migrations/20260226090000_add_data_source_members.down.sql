@@ -0,0 +1,10 @@
+-- Drop virtual data sources and their members
+DO $$
+BEGIN
+    IF to_regclass('prometheus_data_sources') IS NOT NULL THEN
+        DELETE FROM prometheus_data_sources WHERE flavor = 'virtual';
+    END IF;
+END $$;
+
+ALTER TABLE IF EXISTS prometheus_data_sources
+    DROP COLUMN IF EXISTS member_ids;
@@ -0,0 +1,3 @@
+-- Virtual data sources fan queries out to the data sources listed as their members
+ALTER TABLE IF EXISTS prometheus_data_sources
+    ADD COLUMN IF NOT EXISTS member_ids TEXT[];
@@ -0,0 +1,3 @@
+-- Drop annotations and annotation webhooks
+DROP TABLE IF EXISTS annotation_webhooks;
+DROP TABLE IF EXISTS annotations;
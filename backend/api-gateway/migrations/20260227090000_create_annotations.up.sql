@@ -0,0 +1,46 @@
+-- Annotations shown on dashboard graphs, and the webhooks deploy pipelines record them with
+CREATE TABLE IF NOT EXISTS annotations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    dashboard_id UUID,
+    cluster_id UUID,
+    kind VARCHAR(20) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    text TEXT,
+    tags TEXT[] DEFAULT '{}',
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP,
+    source VARCHAR(20) NOT NULL,
+    source_id VARCHAR(255),
+    created_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_annotations_user_id ON annotations(user_id);
+CREATE INDEX IF NOT EXISTS idx_annotations_dashboard_id ON annotations(dashboard_id);
+CREATE INDEX IF NOT EXISTS idx_annotations_cluster_id ON annotations(cluster_id);
+CREATE INDEX IF NOT EXISTS idx_annotations_starts_at ON annotations(starts_at);
+CREATE INDEX IF NOT EXISTS idx_annotations_tags ON annotations USING GIN (tags);
+
+COMMENT ON COLUMN annotations.dashboard_id IS 'Dashboard the annotation is shown on; with neither this nor cluster_id, every dashboard of the user';
+COMMENT ON COLUMN annotations.cluster_id IS 'Cluster whose dashboards show the annotation';
+COMMENT ON COLUMN annotations.ends_at IS 'End of a range; empty for a point in time';
+
+CREATE TABLE IF NOT EXISTS annotation_webhooks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    dashboard_id UUID,
+    cluster_id UUID,
+    tags TEXT[] DEFAULT '{}',
+    token_hash VARCHAR(64) NOT NULL,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_annotation_webhooks_user_id ON annotation_webhooks(user_id);
+
+COMMENT ON COLUMN annotation_webhooks.token_hash IS 'SHA-256 of the bearer token callers present';
@@ -0,0 +1,2 @@
+-- Drop Helm release revisions
+DROP TABLE IF EXISTS helm_release_revisions;
@@ -0,0 +1,19 @@
+-- Revisions of Helm releases as the platform deployed them, for rollbacks and change descriptions
+CREATE TABLE IF NOT EXISTS helm_release_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    release_id UUID NOT NULL REFERENCES helm_releases(id) ON DELETE CASCADE,
+    revision INT NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    chart VARCHAR(500) NOT NULL,
+    chart_version VARCHAR(50) NOT NULL,
+    app_version VARCHAR(50),
+    "values" TEXT,
+    description TEXT,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_helm_release_revision ON helm_release_revisions(release_id, revision);
+
+COMMENT ON COLUMN helm_release_revisions.action IS 'install, upgrade or rollback';
+COMMENT ON COLUMN helm_release_revisions."values" IS 'YAML values of the revision';
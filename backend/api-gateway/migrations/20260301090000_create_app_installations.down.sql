@@ -0,0 +1,2 @@
+-- Drop app catalog installations
+DROP TABLE IF EXISTS app_installations;
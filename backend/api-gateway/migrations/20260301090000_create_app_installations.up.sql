@@ -0,0 +1,29 @@
+-- Apps of the catalog installed in clusters, with their health checks
+CREATE TABLE IF NOT EXISTS app_installations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    app_id VARCHAR(100) NOT NULL,
+    cluster_id UUID NOT NULL REFERENCES k8s_clusters(id) ON DELETE CASCADE,
+    namespace VARCHAR(63) NOT NULL,
+    release_name VARCHAR(53) NOT NULL,
+    release_id UUID NOT NULL,
+    chart_version VARCHAR(50),
+    inputs JSONB,
+    status VARCHAR(20) NOT NULL,
+    status_changed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    checks JSONB,
+    checked_at TIMESTAMP,
+    notify BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_installations_user_id ON app_installations(user_id);
+CREATE INDEX IF NOT EXISTS idx_app_installations_app_id ON app_installations(app_id);
+CREATE INDEX IF NOT EXISTS idx_app_installations_cluster_id ON app_installations(cluster_id);
+CREATE INDEX IF NOT EXISTS idx_app_installations_status ON app_installations(status);
+
+COMMENT ON COLUMN app_installations.release_id IS 'Helm release of the app; kept after the release is uninstalled';
+COMMENT ON COLUMN app_installations.inputs IS 'Install form inputs, without the secret ones';
+COMMENT ON COLUMN app_installations.status IS 'installing, upgrading, healthy, degraded, failed or uninstalled';
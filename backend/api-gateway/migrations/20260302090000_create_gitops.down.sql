@@ -0,0 +1,3 @@
+-- Drop GitOps sources and syncs
+DROP TABLE IF EXISTS gitops_syncs;
+DROP TABLE IF EXISTS gitops_sources;
@@ -0,0 +1,66 @@
+-- Git repositories of manifests kept applied to clusters, and their syncs
+CREATE TABLE IF NOT EXISTS gitops_sources (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    repo_url VARCHAR(500) NOT NULL,
+    branch VARCHAR(255) NOT NULL,
+    path VARCHAR(500),
+    auth_type VARCHAR(20) NOT NULL DEFAULT 'none',
+    username VARCHAR(255),
+    password TEXT,
+    ssh_key TEXT,
+    cluster_id UUID NOT NULL REFERENCES k8s_clusters(id) ON DELETE CASCADE,
+    namespace VARCHAR(63),
+    auto_sync BOOLEAN NOT NULL DEFAULT FALSE,
+    prune BOOLEAN NOT NULL DEFAULT FALSE,
+    self_heal BOOLEAN NOT NULL DEFAULT FALSE,
+    sync_interval INTEGER NOT NULL DEFAULT 300,
+    status VARCHAR(20) NOT NULL,
+    revision VARCHAR(64),
+    head_revision VARCHAR(64),
+    resources JSONB,
+    message TEXT,
+    last_sync_at TIMESTAMP,
+    checked_at TIMESTAMP,
+    next_check_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_gitops_sources_user_id ON gitops_sources(user_id);
+CREATE INDEX IF NOT EXISTS idx_gitops_sources_cluster_id ON gitops_sources(cluster_id);
+CREATE INDEX IF NOT EXISTS idx_gitops_sources_status ON gitops_sources(status);
+CREATE INDEX IF NOT EXISTS idx_gitops_sources_next_check_at ON gitops_sources(next_check_at);
+
+COMMENT ON COLUMN gitops_sources.path IS 'Directory of the manifests in the repository; the root when empty';
+COMMENT ON COLUMN gitops_sources.namespace IS 'Namespace of namespaced manifests that name none';
+COMMENT ON COLUMN gitops_sources.status IS 'pending, syncing, synced, out_of_sync or failed';
+COMMENT ON COLUMN gitops_sources.revision IS 'Commit the last successful sync applied';
+COMMENT ON COLUMN gitops_sources.resources IS 'Objects the source manages and how they compare to their manifests';
+
+CREATE TABLE IF NOT EXISTS gitops_syncs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    source_id UUID NOT NULL REFERENCES gitops_sources(id) ON DELETE CASCADE,
+    trigger VARCHAR(20) NOT NULL,
+    revision VARCHAR(64),
+    commit_message TEXT,
+    commit_author VARCHAR(255),
+    status VARCHAR(20) NOT NULL,
+    applied INTEGER NOT NULL DEFAULT 0,
+    pruned INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    resources JSONB,
+    message TEXT,
+    triggered_by VARCHAR(255),
+    started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_gitops_syncs_source_id ON gitops_syncs(source_id, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_gitops_syncs_status ON gitops_syncs(status);
+
+COMMENT ON COLUMN gitops_syncs.trigger IS 'auto, self_heal, manual or rollback';
+COMMENT ON COLUMN gitops_syncs.resources IS 'Objects the sync created, configured, left unchanged, pruned or failed to apply';
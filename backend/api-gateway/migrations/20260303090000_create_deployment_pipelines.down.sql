@@ -0,0 +1,3 @@
+-- Drop deployment pipelines and their runs
+DROP TABLE IF EXISTS deployment_pipeline_runs;
+DROP TABLE IF EXISTS deployment_pipelines;
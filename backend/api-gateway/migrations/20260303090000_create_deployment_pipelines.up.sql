@@ -0,0 +1,65 @@
+-- Deployment pipelines CI triggers with an image tag, and their runs
+CREATE TABLE IF NOT EXISTS deployment_pipelines (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    cluster_id UUID NOT NULL REFERENCES k8s_clusters(id) ON DELETE CASCADE,
+    namespace VARCHAR(63) NOT NULL,
+    target_type VARCHAR(20) NOT NULL,
+    deployment VARCHAR(253),
+    container VARCHAR(253),
+    release_id UUID REFERENCES helm_releases(id) ON DELETE CASCADE,
+    values_key VARCHAR(255),
+    image_repository VARCHAR(500),
+    tag_pattern VARCHAR(255),
+    rollout_timeout INTEGER NOT NULL DEFAULT 600,
+    rollback_on_failure BOOLEAN NOT NULL DEFAULT FALSE,
+    callback_url VARCHAR(2048),
+    secret VARCHAR(255) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    last_tag VARCHAR(255),
+    last_status VARCHAR(20),
+    last_run_at TIMESTAMP,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_deployment_pipelines_user_id ON deployment_pipelines(user_id);
+CREATE INDEX IF NOT EXISTS idx_deployment_pipelines_cluster_id ON deployment_pipelines(cluster_id);
+CREATE INDEX IF NOT EXISTS idx_deployment_pipelines_release_id ON deployment_pipelines(release_id);
+
+COMMENT ON COLUMN deployment_pipelines.target_type IS 'deployment or helm';
+COMMENT ON COLUMN deployment_pipelines.container IS 'Container whose image is set; the deployment''s only container when empty';
+COMMENT ON COLUMN deployment_pipelines.values_key IS 'Dotted values key Helm pipelines set the tag at';
+COMMENT ON COLUMN deployment_pipelines.image_repository IS 'Repository tags are applied to; the container''s current one when empty';
+COMMENT ON COLUMN deployment_pipelines.secret IS 'HMAC-SHA256 key webhook requests and callbacks are signed with';
+
+CREATE TABLE IF NOT EXISTS deployment_pipeline_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    pipeline_id UUID NOT NULL REFERENCES deployment_pipelines(id) ON DELETE CASCADE,
+    trigger VARCHAR(20) NOT NULL,
+    tag VARCHAR(255) NOT NULL,
+    image VARCHAR(500),
+    previous VARCHAR(500),
+    commit VARCHAR(64),
+    ref VARCHAR(255),
+    build_url VARCHAR(2048),
+    status VARCHAR(20) NOT NULL,
+    rollouts JSONB,
+    message TEXT,
+    callback_status INTEGER,
+    callback_error TEXT,
+    triggered_by VARCHAR(255),
+    started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_deployment_pipeline_runs_pipeline_id ON deployment_pipeline_runs(pipeline_id, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_deployment_pipeline_runs_status ON deployment_pipeline_runs(status);
+
+COMMENT ON COLUMN deployment_pipeline_runs.trigger IS 'webhook or manual';
+COMMENT ON COLUMN deployment_pipeline_runs.status IS 'running, succeeded, failed or rolled_back';
+COMMENT ON COLUMN deployment_pipeline_runs.previous IS 'Image or values tag the run replaced, restored when it rolls back';
+COMMENT ON COLUMN deployment_pipeline_runs.rollouts IS 'Deployments the run waited for and how far they rolled out';
@@ -0,0 +1,2 @@
+-- Drop canary rollouts
+DROP TABLE IF EXISTS canary_rollouts;
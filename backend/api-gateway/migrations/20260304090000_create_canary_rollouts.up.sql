@@ -0,0 +1,49 @@
+-- Canary and blue/green rollouts of deployments, with their analyses
+CREATE TABLE IF NOT EXISTS canary_rollouts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    cluster_id UUID NOT NULL REFERENCES k8s_clusters(id) ON DELETE CASCADE,
+    namespace VARCHAR(63) NOT NULL,
+    deployment VARCHAR(253) NOT NULL,
+    container VARCHAR(253) NOT NULL,
+    image VARCHAR(500) NOT NULL,
+    previous VARCHAR(500),
+    strategy VARCHAR(20) NOT NULL,
+    traffic VARCHAR(20) NOT NULL,
+    service VARCHAR(63) NOT NULL,
+    ingress VARCHAR(253),
+    steps JSONB,
+    metrics JSONB,
+    slo_ids JSONB,
+    alert_severity VARCHAR(20),
+    analysis_interval INTEGER NOT NULL DEFAULT 60,
+    failure_limit INTEGER NOT NULL DEFAULT 0,
+    progress_timeout INTEGER NOT NULL DEFAULT 600,
+    status VARCHAR(20) NOT NULL,
+    step INTEGER NOT NULL DEFAULT 0,
+    weight INTEGER NOT NULL DEFAULT 0,
+    stable_replicas INTEGER,
+    stable_hash VARCHAR(63),
+    failures INTEGER NOT NULL DEFAULT 0,
+    analyses JSONB,
+    action VARCHAR(20),
+    action_by VARCHAR(255),
+    message TEXT,
+    created_by VARCHAR(255),
+    step_started_at TIMESTAMP,
+    shifted_at TIMESTAMP,
+    last_analysis_at TIMESTAMP,
+    started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_canary_rollouts_user_id ON canary_rollouts(user_id);
+CREATE INDEX IF NOT EXISTS idx_canary_rollouts_cluster_id ON canary_rollouts(cluster_id, namespace, deployment);
+CREATE INDEX IF NOT EXISTS idx_canary_rollouts_status ON canary_rollouts(status);
+
+COMMENT ON COLUMN canary_rollouts.strategy IS 'canary or blue_green';
+COMMENT ON COLUMN canary_rollouts.traffic IS 'service: replica-weighted behind the Service; nginx: weighted ingress-nginx canary ingress';
+COMMENT ON COLUMN canary_rollouts.status IS 'progressing, paused, promoting, promoted, rolled_back or failed';
+COMMENT ON COLUMN canary_rollouts.stable_hash IS 'pod-template-hash of the stable pods the Service is pinned to';
+COMMENT ON COLUMN canary_rollouts.action IS 'promote, promote_full or abort, waiting to be applied';
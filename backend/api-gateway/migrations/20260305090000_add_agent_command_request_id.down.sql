@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS agent_commands
+    DROP COLUMN IF EXISTS request_id;
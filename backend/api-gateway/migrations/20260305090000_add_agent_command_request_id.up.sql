@@ -0,0 +1,3 @@
+-- Agent commands keep the correlation ID of the request that queued them
+ALTER TABLE IF EXISTS agent_commands
+    ADD COLUMN IF NOT EXISTS request_id VARCHAR(64);
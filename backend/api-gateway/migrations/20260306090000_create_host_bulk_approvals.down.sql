@@ -0,0 +1,5 @@
+-- Drop host bulk approvals and host groups
+DROP TABLE IF EXISTS host_bulk_approvals;
+DROP INDEX IF EXISTS idx_hosts_host_group;
+ALTER TABLE hosts DROP COLUMN IF EXISTS host_group;
+COMMENT ON COLUMN hosts.status IS 'Host status: pending, approved, rejected, offline, online';
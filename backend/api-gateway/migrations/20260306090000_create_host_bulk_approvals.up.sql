@@ -0,0 +1,27 @@
+-- Host groups, and the approvals of destructive bulk host actions
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS host_group VARCHAR(63) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_hosts_host_group ON hosts(host_group);
+
+COMMENT ON COLUMN hosts.host_group IS 'Name of the group the host belongs to; empty is ungrouped';
+COMMENT ON COLUMN hosts.status IS 'Host status: pending, approved, rejected, offline, online, degraded or retired';
+
+CREATE TABLE IF NOT EXISTS host_bulk_approvals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    action VARCHAR(20) NOT NULL,
+    request JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    requested_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    review_comment TEXT,
+    reviewed_at TIMESTAMP,
+    result JSONB,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_host_bulk_approvals_status ON host_bulk_approvals(status);
+CREATE INDEX IF NOT EXISTS idx_host_bulk_approvals_requested_by ON host_bulk_approvals(requested_by);
+
+COMMENT ON COLUMN host_bulk_approvals.action IS 'delete or retire';
+COMMENT ON COLUMN host_bulk_approvals.status IS 'pending, approved (and applied), rejected or expired';
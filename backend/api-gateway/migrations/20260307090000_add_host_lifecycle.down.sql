@@ -0,0 +1,11 @@
+-- Drop host lifecycle states, per-host agent tokens and host archives
+DROP TABLE IF EXISTS host_archives;
+DROP TABLE IF EXISTS host_lifecycle_events;
+UPDATE hosts SET status = 'retired' WHERE lifecycle = 'retired';
+DROP INDEX IF EXISTS idx_hosts_agent_token_hash;
+DROP INDEX IF EXISTS idx_hosts_lifecycle;
+ALTER TABLE hosts DROP COLUMN IF EXISTS agent_token_revoked_at;
+ALTER TABLE hosts DROP COLUMN IF EXISTS agent_token_hash;
+ALTER TABLE hosts DROP COLUMN IF EXISTS lifecycle_changed_at;
+ALTER TABLE hosts DROP COLUMN IF EXISTS lifecycle;
+COMMENT ON COLUMN hosts.status IS 'Host status: pending, approved, rejected, offline, online, degraded or retired';
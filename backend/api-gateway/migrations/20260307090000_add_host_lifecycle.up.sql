@@ -0,0 +1,44 @@
+-- Host lifecycle states, their history, per-host agent tokens and the archives of retired hosts
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS lifecycle VARCHAR(20) NOT NULL DEFAULT 'active';
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS lifecycle_changed_at TIMESTAMP;
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS agent_token_hash VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS agent_token_revoked_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_hosts_lifecycle ON hosts(lifecycle);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_hosts_agent_token_hash ON hosts(agent_token_hash) WHERE agent_token_hash <> '';
+
+-- Hosts awaiting approval are still being provisioned; retired was a status until now
+UPDATE hosts SET lifecycle = 'provisioning' WHERE status = 'pending';
+UPDATE hosts SET lifecycle = 'retired', lifecycle_changed_at = status_changed_at, status = 'offline' WHERE status = 'retired';
+
+COMMENT ON COLUMN hosts.status IS 'Host status: pending, approved, rejected, offline, online or degraded';
+COMMENT ON COLUMN hosts.lifecycle IS 'Host lifecycle: provisioning, active, maintenance, decommissioning or retired';
+COMMENT ON COLUMN hosts.agent_token_hash IS 'SHA-256 of the host''s own agent token; empty while its agent uses the shared token';
+
+CREATE TABLE IF NOT EXISTS host_lifecycle_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    host_id UUID NOT NULL REFERENCES hosts(id) ON DELETE CASCADE,
+    from_state VARCHAR(20) NOT NULL,
+    to_state VARCHAR(20) NOT NULL,
+    reason TEXT,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_host_lifecycle_events_host_id ON host_lifecycle_events(host_id, created_at);
+
+-- Archives outlive their hosts, so they do not reference them
+CREATE TABLE IF NOT EXISTS host_archives (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    host_id UUID NOT NULL,
+    hostname VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(64) NOT NULL,
+    agent_token_hash VARCHAR(64) NOT NULL DEFAULT '',
+    history JSONB NOT NULL,
+    archived_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    archived_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_host_archives_host_id ON host_archives(host_id);
+CREATE INDEX IF NOT EXISTS idx_host_archives_agent_token_hash ON host_archives(agent_token_hash) WHERE agent_token_hash <> '';
+
+COMMENT ON TABLE host_archives IS 'Lifecycle, agent commands, alerts and events of decommissioned hosts';
@@ -0,0 +1,186 @@
+// Package main is the entry point for the MyOps cluster connector. It runs inside a
+// cluster, dials out to the gateway and proxies the connections the gateway opens
+// over that tunnel to the cluster's API server, authenticated as its service account.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/wangjialin/myops/pkg/k8s"
+)
+
+var (
+	version   = "1.0.0"
+	buildTime = "unknown"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	keepAliveInterval = 30 * time.Second
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	log.Printf("MyOps Cluster Connector v%s (built: %s)", version, buildTime)
+
+	gatewayURL := strings.TrimRight(os.Getenv("MYOPS_GATEWAY_URL"), "/")
+	token := os.Getenv("MYOPS_CONNECTOR_TOKEN")
+	if gatewayURL == "" || token == "" {
+		log.Fatal("MYOPS_GATEWAY_URL and MYOPS_CONNECTOR_TOKEN are required")
+	}
+
+	proxy, err := newAPIServerProxy()
+	if err != nil {
+		log.Fatalf("Failed to set up the API server proxy: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	delay := minReconnectDelay
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := serveTunnel(ctx, gatewayURL, token, proxy)
+		if ctx.Err() != nil {
+			break
+		}
+		// A tunnel that stayed up for a while was healthy; reconnect quickly
+		if time.Since(start) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+		log.Printf("Tunnel closed: %v; reconnecting in %s", err, delay)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+	log.Println("Connector stopped")
+}
+
+// serveTunnel dials the gateway and serves the streams it opens until the tunnel drops
+func serveTunnel(ctx context.Context, gatewayURL, token string, proxy http.Handler) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gatewayURL+"/api/v1/cluster-connector/connect", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", k8s.TunnelProtocol)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Connector-Version", version)
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to dial gateway: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return fmt.Errorf("gateway refused the tunnel (%d): %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return fmt.Errorf("gateway connection cannot be upgraded")
+	}
+
+	log.Printf("Tunnel to %s established", gatewayURL)
+	session := k8s.NewTunnelSession(conn)
+	go session.KeepAlive(keepAliveInterval)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-session.Done():
+		}
+	}()
+
+	server := &http.Server{Handler: proxy}
+	server.Serve(session)
+	return session.Err()
+}
+
+// newAPIServerProxy proxies requests to the API server with the pod's service
+// account token, including the upgraded connections used by exec and port-forward
+func newAPIServerProxy() (http.Handler, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running inside a cluster")
+	}
+	target := &url.URL{Scheme: "https", Host: net.JoinHostPort(host, port)}
+
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("cluster CA is not valid PEM")
+	}
+	tokens := &tokenFile{path: serviceAccountDir + "/token"}
+	if _, err := tokens.get(); err != nil {
+		return nil, err
+	}
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.Host = target.Host
+			if token, err := tokens.get(); err == nil {
+				r.Out.Header.Set("Authorization", "Bearer "+token)
+			}
+		},
+		Transport: &http.Transport{
+			TLSClientConfig:     &tls.Config{RootCAs: pool},
+			ForceAttemptHTTP2:   false, // upgrades need HTTP/1.1
+			MaxIdleConnsPerHost: 32,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		FlushInterval: -1, // watches and logs stream
+		ErrorLog:      log.Default(),
+	}, nil
+}
+
+// tokenFile reads the projected service account token, which the kubelet rotates
+type tokenFile struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+}
+
+func (t *tokenFile) get() (string, error) {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the service account token: %w", err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token == "" || !info.ModTime().Equal(t.modTime) {
+		data, err := os.ReadFile(t.path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the service account token: %w", err)
+		}
+		t.token, t.modTime = strings.TrimSpace(string(data)), info.ModTime()
+	}
+	return t.token, nil
+}
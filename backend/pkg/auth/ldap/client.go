@@ -144,6 +144,34 @@ func (c *Client) Authenticate(username, password string) (*ldap.Entry, error) {
 	return sr.Entries[0], nil
 }
 
+// SearchUsers returns every entry under the base DN matching filter, using paged
+// searches so large directories are not cut off by server size limits
+func (c *Client) SearchUsers(filter string) ([]*ldap.Entry, error) {
+	conn, err := c.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := c.Bind(conn); err != nil {
+		return nil, fmt.Errorf("failed to bind to LDAP server: %w", err)
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		c.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter,
+		c.config.UserAttributes,
+		nil,
+	)
+
+	sr, err := conn.SearchWithPaging(searchRequest, 500)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for users: %w", err)
+	}
+	return sr.Entries, nil
+}
+
 // GetUserAttribute retrieves a specific attribute from an LDAP entry
 func GetUserAttribute(entry *ldap.Entry, attributeName string) string {
 	for _, attr := range entry.Attributes {
@@ -154,6 +182,16 @@ func GetUserAttribute(entry *ldap.Entry, attributeName string) string {
 	return ""
 }
 
+// GetUserAttributeValues retrieves all values of an attribute from an LDAP entry
+func GetUserAttributeValues(entry *ldap.Entry, attributeName string) []string {
+	for _, attr := range entry.Attributes {
+		if attr.Name == attributeName {
+			return attr.Values
+		}
+	}
+	return nil
+}
+
 // getLDAPAddress extracts the host:port from the LDAP URL
 func (c *Client) getLDAPAddress() string {
 	// Remove ldap:// or ldaps:// prefix
@@ -0,0 +1,105 @@
+// Package totp provides RFC 6238 time-based one-time passwords
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parameters understood by every common authenticator app
+const (
+	period    = 30 * time.Second
+	digits    = 6
+	skew      = 1 // Codes of this many periods either side of now are accepted
+	secretLen = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random base32 encoded secret
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretLen)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+// Code returns the code of secret for the period containing t
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return code(key, uint64(t.Unix()/int64(period/time.Second))), nil
+}
+
+// Validate checks code against secret at t, allowing for clock skew between the
+// server and the authenticator
+func Validate(secret, code string, t time.Time) bool {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != digits {
+		return false
+	}
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return false
+	}
+
+	counter := t.Unix() / int64(period/time.Second)
+	valid := false
+	for offset := int64(-skew); offset <= skew; offset++ {
+		if subtle.ConstantTimeCompare([]byte(codeAt(key, counter+offset)), []byte(code)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// URI returns the otpauth:// provisioning URI authenticator apps read from QR codes
+func URI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(digits))
+	params.Set("period", fmt.Sprint(int(period/time.Second)))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret: %w", err)
+	}
+	return key, nil
+}
+
+func codeAt(key []byte, counter int64) string {
+	if counter < 0 {
+		return ""
+	}
+	return code(key, uint64(counter))
+}
+
+// code is the HOTP value of key at counter (RFC 4226)
+func code(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", digits, value%1000000)
+}
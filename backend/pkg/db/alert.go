@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// AlertRuleRepository handles alert rule database operations
+type AlertRuleRepository struct {
+	db *gorm.DB
+}
+
+// NewAlertRuleRepository creates a new AlertRuleRepository
+func NewAlertRuleRepository(db *gorm.DB) *AlertRuleRepository {
+	return &AlertRuleRepository{db: db}
+}
+
+// AlertRuleFilter represents filter options for listing alert rules
+type AlertRuleFilter struct {
+	UserID     uuid.UUID
+	Enabled    *bool
+	TargetType string
+	Tags       string // Selector over the rules' tags; see WithTags
+	Page       int
+	PageSize   int
+}
+
+// Create creates a new alert rule
+func (r *AlertRuleRepository) Create(ctx context.Context, rule *model.AlertRule) error {
+	return r.db.WithContext(ctx).Create(rule).Error
+}
+
+// FindOwned finds an alert rule by ID that belongs to userID
+func (r *AlertRuleRepository) FindOwned(ctx context.Context, id, userID uuid.UUID) (*model.AlertRule, error) {
+	var rule model.AlertRule
+	if err := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&rule).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &rule, nil
+}
+
+// List returns a page of the user's alert rules, newest first, and how many match
+func (r *AlertRuleRepository) List(ctx context.Context, filter *AlertRuleFilter) ([]model.AlertRule, int64, error) {
+	query := r.db.WithContext(ctx).Model(&model.AlertRule{}).Where("user_id = ?", filter.UserID)
+	if filter.Enabled != nil {
+		query = query.Where("enabled = ?", *filter.Enabled)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	query, err := WithTags(query, model.TagResourceAlertRule, filter.Tags)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var rules []model.AlertRule
+	if err := paginate(query.Order("created_at DESC"), filter.Page, filter.PageSize).Find(&rules).Error; err != nil {
+		return nil, 0, err
+	}
+	return rules, total, nil
+}
+
+// Update writes the named fields of an existing alert rule
+func (r *AlertRuleRepository) Update(ctx context.Context, rule *model.AlertRule, fields ...string) error {
+	return updateFields(r.db.WithContext(ctx), rule, fields)
+}
+
+// Delete deletes an alert rule with the alerts it raised
+func (r *AlertRuleRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return DeleteWithChildren(r.db.WithContext(ctx), &model.AlertRule{ID: id}, "rule_id", id, &model.Alert{})
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// ClusterRepository handles Kubernetes cluster database operations
+type ClusterRepository struct {
+	db *gorm.DB
+}
+
+// NewClusterRepository creates a new ClusterRepository
+func NewClusterRepository(db *gorm.DB) *ClusterRepository {
+	return &ClusterRepository{db: db}
+}
+
+// ClusterFilter represents filter options for listing clusters
+type ClusterFilter struct {
+	UserID   uuid.UUID
+	Status   model.ClusterStatus
+	Type     model.ClusterType
+	Provider string
+	Tags     string // Selector over the clusters' tags; see WithTags
+	Page     int
+	PageSize int
+}
+
+// Create creates a new cluster
+func (r *ClusterRepository) Create(ctx context.Context, cluster *model.K8sCluster) error {
+	return r.db.WithContext(ctx).Create(cluster).Error
+}
+
+// FindByID finds a cluster by ID
+func (r *ClusterRepository) FindByID(ctx context.Context, id uuid.UUID) (*model.K8sCluster, error) {
+	var cluster model.K8sCluster
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&cluster).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &cluster, nil
+}
+
+// FindOwned finds a cluster by ID that belongs to userID
+func (r *ClusterRepository) FindOwned(ctx context.Context, id, userID uuid.UUID) (*model.K8sCluster, error) {
+	var cluster model.K8sCluster
+	if err := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&cluster).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &cluster, nil
+}
+
+// List returns a page of the user's clusters, newest first, and how many match
+func (r *ClusterRepository) List(ctx context.Context, filter *ClusterFilter) ([]model.K8sCluster, int64, error) {
+	query := r.db.WithContext(ctx).Model(&model.K8sCluster{}).Where("user_id = ?", filter.UserID)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Provider != "" {
+		query = query.Where("provider = ?", filter.Provider)
+	}
+	query, err := WithTags(query, model.TagResourceCluster, filter.Tags)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var clusters []model.K8sCluster
+	if err := paginate(query.Order("created_at DESC"), filter.Page, filter.PageSize).Find(&clusters).Error; err != nil {
+		return nil, 0, err
+	}
+	return clusters, total, nil
+}
+
+// Update writes the named fields of an existing cluster
+func (r *ClusterRepository) Update(ctx context.Context, cluster *model.K8sCluster, fields ...string) error {
+	return updateFields(r.db.WithContext(ctx), cluster, fields)
+}
+
+// Delete deletes a cluster with the nodes and namespaces recorded for it
+func (r *ClusterRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return DeleteWithChildren(r.db.WithContext(ctx), &model.K8sCluster{ID: id}, "cluster_id", id,
+		&model.ClusterNode{}, &model.ClusterNamespace{})
+}
+
+// ListNodes returns the nodes last read from a cluster
+func (r *ClusterRepository) ListNodes(ctx context.Context, clusterID uuid.UUID) ([]model.ClusterNode, error) {
+	var nodes []model.ClusterNode
+	err := r.db.WithContext(ctx).Where("cluster_id = ?", clusterID).Order("name").Find(&nodes).Error
+	return nodes, err
+}
+
+// ReplaceNodes replaces the nodes recorded for a cluster
+func (r *ClusterRepository) ReplaceNodes(ctx context.Context, clusterID uuid.UUID, nodes []model.ClusterNode) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("cluster_id = ?", clusterID).Delete(&model.ClusterNode{}).Error; err != nil {
+			return err
+		}
+		if len(nodes) == 0 {
+			return nil
+		}
+		return tx.Create(&nodes).Error
+	})
+}
+
+// FindVeleroInstallation finds the Velero installation of a cluster
+func (r *ClusterRepository) FindVeleroInstallation(ctx context.Context, clusterID uuid.UUID) (*model.VeleroInstallation, error) {
+	var installation model.VeleroInstallation
+	if err := r.db.WithContext(ctx).Where("cluster_id = ?", clusterID).First(&installation).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &installation, nil
+}
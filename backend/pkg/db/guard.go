@@ -0,0 +1,363 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrDatabaseUnavailable is returned without reaching the database while the
+// guard's circuit breaker is open
+var ErrDatabaseUnavailable = errors.New("database temporarily unavailable")
+
+// GuardState is the state of the guard's circuit breaker
+type GuardState string
+
+const (
+	GuardClosed   GuardState = "closed"    // Statements run normally
+	GuardOpen     GuardState = "open"      // Writes are refused until the cooldown ends
+	GuardHalfOpen GuardState = "half-open" // One write is let through to probe the database
+)
+
+// GuardConfig tunes a Guard. Zero values use the defaults.
+type GuardConfig struct {
+	FailureThreshold int           // Consecutive connection failures that open the breaker, 5 by default
+	Cooldown         time.Duration // How long the breaker stays open before probing, 10s by default
+	ReadRetries      int           // Retries of a failed read, 2 by default; negative disables them
+	RetryBackoff     time.Duration // Wait before the first retry, doubled for each later one, 100ms by default
+}
+
+// GuardStats is a snapshot of the guard's connection health
+type GuardStats struct {
+	State               GuardState `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	LastFailureAt       *time.Time `json:"lastFailureAt,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	Opens               uint64     `json:"opens"`    // Times the breaker opened
+	Failures            uint64     `json:"failures"` // Statements that failed to reach the database
+	Retries             uint64     `json:"retries"`  // Read retries
+	Rejected            uint64     `json:"rejected"` // Writes refused while the breaker was open
+}
+
+// Guard is the connection pool GORM runs statements through. It tracks whether
+// the database is reachable, retries idempotent reads that fail on a broken
+// connection, and refuses writes with ErrDatabaseUnavailable once connection
+// failures pile up, so a short outage fails fast instead of tying up requests.
+//
+// Only connection-level failures count against the database; query errors such
+// as constraint violations prove it is reachable. Statements inside a
+// transaction run on the transaction directly and are not retried.
+type Guard struct {
+	db  *sql.DB
+	cfg GuardConfig
+
+	mu            sync.Mutex
+	state         GuardState
+	failures      int
+	probing       bool
+	openedAt      time.Time
+	lastFailureAt time.Time
+	lastError     string
+	opens         uint64
+	failuresTotal uint64
+	retries       uint64
+	rejected      uint64
+}
+
+// NewGuard wraps the connection pool of gdb, so every statement run through gdb
+// or a session derived from it afterwards goes through the returned guard
+func NewGuard(gdb *gorm.DB, cfg GuardConfig) (*Guard, error) {
+	sqlDB, err := gdb.DB()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 10 * time.Second
+	}
+	if cfg.ReadRetries == 0 {
+		cfg.ReadRetries = 2
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 100 * time.Millisecond
+	}
+
+	g := &Guard{db: sqlDB, cfg: cfg, state: GuardClosed}
+	gdb.ConnPool = g
+	gdb.Statement.ConnPool = g
+	return g, nil
+}
+
+// GuardOf returns the guard installed on gdb, or nil
+func GuardOf(gdb *gorm.DB) *Guard {
+	if gdb == nil {
+		return nil
+	}
+	g, _ := gdb.ConnPool.(*Guard)
+	return g
+}
+
+// GetDBConn returns the underlying pool, so gorm.DB.DB keeps working
+func (g *Guard) GetDBConn() (*sql.DB, error) {
+	return g.db, nil
+}
+
+// PrepareContext prepares a statement on the underlying pool
+func (g *Guard) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	stmt, err := g.db.PrepareContext(ctx, query)
+	g.record(err)
+	return stmt, err
+}
+
+// ExecContext runs a write unless the breaker refuses it
+func (g *Guard) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if err := g.allowWrite(); err != nil {
+		return nil, err
+	}
+	result, err := g.db.ExecContext(ctx, query, args...)
+	g.record(err)
+	return result, err
+}
+
+// QueryContext retries reads that fail to reach the database. Other statements,
+// such as an INSERT ... RETURNING, are writes.
+func (g *Guard) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if !isReadQuery(query) {
+		if err := g.allowWrite(); err != nil {
+			return nil, err
+		}
+		rows, err := g.db.QueryContext(ctx, query, args...)
+		g.record(err)
+		return rows, err
+	}
+
+	backoff := g.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		rows, err := g.db.QueryContext(ctx, query, args...)
+		g.record(err)
+		if err == nil || !isConnectionError(err) || attempt >= g.cfg.ReadRetries || g.State() == GuardOpen {
+			return rows, err
+		}
+
+		g.mu.Lock()
+		g.retries++
+		g.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// QueryRowContext runs a single-row query. Its error only surfaces on Scan, so it
+// is neither retried nor tracked.
+func (g *Guard) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return g.db.QueryRowContext(ctx, query, args...)
+}
+
+// BeginTx starts a transaction unless the breaker refuses writes
+func (g *Guard) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if err := g.allowWrite(); err != nil {
+		return nil, err
+	}
+	tx, err := g.db.BeginTx(ctx, opts)
+	g.record(err)
+	return tx, err
+}
+
+// State returns the breaker state
+func (g *Guard) State() GuardState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.state
+}
+
+// Available reports whether writes are currently let through
+func (g *Guard) Available() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch g.state {
+	case GuardOpen:
+		return time.Since(g.openedAt) >= g.cfg.Cooldown
+	case GuardHalfOpen:
+		return !g.probing
+	}
+	return true
+}
+
+// RetryAfter is how long clients should wait before retrying while the database
+// is unavailable, at least a second
+func (g *Guard) RetryAfter() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.state == GuardOpen {
+		if remaining := g.cfg.Cooldown - time.Since(g.openedAt); remaining > time.Second {
+			return remaining.Round(time.Second)
+		}
+	}
+	return time.Second
+}
+
+// Stats returns a snapshot of the guard's connection health
+func (g *Guard) Stats() GuardStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	stats := GuardStats{
+		State:               g.state,
+		ConsecutiveFailures: g.failures,
+		LastError:           g.lastError,
+		Opens:               g.opens,
+		Failures:            g.failuresTotal,
+		Retries:             g.retries,
+		Rejected:            g.rejected,
+	}
+	if g.state != GuardClosed {
+		openedAt := g.openedAt
+		stats.OpenedAt = &openedAt
+	}
+	if !g.lastFailureAt.IsZero() {
+		lastFailureAt := g.lastFailureAt
+		stats.LastFailureAt = &lastFailureAt
+	}
+	return stats
+}
+
+// WriteMetrics writes the guard's state and counters, and the pool's connection
+// counts, in the Prometheus text format
+func (g *Guard) WriteMetrics(w io.Writer) {
+	stats := g.Stats()
+	pool := g.db.Stats()
+
+	fmt.Fprintln(w, "# HELP myops_db_breaker_state Database circuit breaker state, 1 for the current one.")
+	fmt.Fprintln(w, "# TYPE myops_db_breaker_state gauge")
+	for _, state := range []GuardState{GuardClosed, GuardOpen, GuardHalfOpen} {
+		value := 0
+		if stats.State == state {
+			value = 1
+		}
+		fmt.Fprintf(w, "myops_db_breaker_state{state=%q} %d\n", state, value)
+	}
+
+	metrics := []struct {
+		name, kind, help string
+		value            interface{}
+	}{
+		{"myops_db_consecutive_failures", "gauge", "Connection failures since the database last answered.", stats.ConsecutiveFailures},
+		{"myops_db_breaker_opens_total", "counter", "Times the database circuit breaker opened.", stats.Opens},
+		{"myops_db_failures_total", "counter", "Statements that failed to reach the database.", stats.Failures},
+		{"myops_db_read_retries_total", "counter", "Reads retried after a connection failure.", stats.Retries},
+		{"myops_db_rejected_total", "counter", "Writes refused while the circuit breaker was open.", stats.Rejected},
+		{"myops_db_pool_open_connections", "gauge", "Open connections in the pool.", pool.OpenConnections},
+		{"myops_db_pool_in_use_connections", "gauge", "Connections currently in use.", pool.InUse},
+		{"myops_db_pool_idle_connections", "gauge", "Idle connections in the pool.", pool.Idle},
+		{"myops_db_pool_wait_total", "counter", "Connections waited for.", pool.WaitCount},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+}
+
+// allowWrite refuses a write while the breaker is open. Once the cooldown ends a
+// single write probes the database; further writes wait for its outcome.
+func (g *Guard) allowWrite() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch g.state {
+	case GuardOpen:
+		if time.Since(g.openedAt) < g.cfg.Cooldown {
+			g.rejected++
+			return ErrDatabaseUnavailable
+		}
+		g.state = GuardHalfOpen
+		g.probing = true
+	case GuardHalfOpen:
+		if g.probing {
+			g.rejected++
+			return ErrDatabaseUnavailable
+		}
+		g.probing = true
+	}
+	return nil
+}
+
+// record updates connection health from the outcome of a statement
+func (g *Guard) record(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// A cancelled request says nothing about the database
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		g.probing = false
+		return
+	}
+	if !isConnectionError(err) {
+		g.state = GuardClosed
+		g.failures = 0
+		g.probing = false
+		return
+	}
+
+	now := time.Now()
+	g.failures++
+	g.failuresTotal++
+	g.lastFailureAt = now
+	g.lastError = err.Error()
+	if g.state == GuardHalfOpen || (g.state == GuardClosed && g.failures >= g.cfg.FailureThreshold) {
+		g.state = GuardOpen
+		g.openedAt = now
+		g.opens++
+	}
+	g.probing = false
+}
+
+// isReadQuery reports whether query only reads, so running it twice is harmless
+func isReadQuery(query string) bool {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	if len(query) < 6 {
+		return false
+	}
+	return strings.EqualFold(query[:6], "SELECT") || strings.EqualFold(query[:4], "SHOW")
+}
+
+// isConnectionError reports whether err means the database could not be
+// reached, rather than that it rejected the statement
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// PostgreSQL connection exceptions (class 08), shutdowns and exhausted connection slots
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		code := stateErr.SQLState()
+		return strings.HasPrefix(code, "08") || code == "57P01" || code == "57P02" || code == "57P03" || code == "53300"
+	}
+	return false
+}
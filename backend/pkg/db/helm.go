@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// HelmRepoRepository handles Helm chart repository database operations
+type HelmRepoRepository struct {
+	db *gorm.DB
+}
+
+// NewHelmRepoRepository creates a new HelmRepoRepository
+func NewHelmRepoRepository(db *gorm.DB) *HelmRepoRepository {
+	return &HelmRepoRepository{db: db}
+}
+
+// HelmRepoFilter represents filter options for listing Helm repositories
+type HelmRepoFilter struct {
+	UserID   uuid.UUID
+	Status   model.HelmRepoStatus
+	Type     model.HelmRepoType
+	Page     int
+	PageSize int
+}
+
+// Create creates a new Helm repository
+func (r *HelmRepoRepository) Create(ctx context.Context, repo *model.HelmRepository) error {
+	return r.db.WithContext(ctx).Create(repo).Error
+}
+
+// FindOwned finds a Helm repository by ID that belongs to userID
+func (r *HelmRepoRepository) FindOwned(ctx context.Context, id, userID uuid.UUID) (*model.HelmRepository, error) {
+	var repo model.HelmRepository
+	if err := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&repo).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &repo, nil
+}
+
+// NameTaken reports whether another of the user's Helm repositories is called name
+func (r *HelmRepoRepository) NameTaken(ctx context.Context, userID uuid.UUID, name string, except uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.HelmRepository{}).
+		Where("user_id = ? AND name = ? AND id <> ?", userID, name, except).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// List returns a page of the user's Helm repositories, newest first, and how many match
+func (r *HelmRepoRepository) List(ctx context.Context, filter *HelmRepoFilter) ([]model.HelmRepository, int64, error) {
+	query := r.db.WithContext(ctx).Model(&model.HelmRepository{}).Where("user_id = ?", filter.UserID)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var repos []model.HelmRepository
+	if err := paginate(query.Order("created_at DESC"), filter.Page, filter.PageSize).Find(&repos).Error; err != nil {
+		return nil, 0, err
+	}
+	return repos, total, nil
+}
+
+// Update writes the named fields of an existing Helm repository
+func (r *HelmRepoRepository) Update(ctx context.Context, repo *model.HelmRepository, fields ...string) error {
+	return updateFields(r.db.WithContext(ctx), repo, fields)
+}
+
+// Delete deletes a Helm repository
+func (r *HelmRepoRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Delete(&model.HelmRepository{}, "id = ?", id).Error
+}
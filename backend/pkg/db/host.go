@@ -7,6 +7,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 	"github.com/wangjialin/myops/pkg/model"
+	"github.com/wangjialin/myops/pkg/sanitize"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -62,6 +63,15 @@ func (r *HostRepository) ExistsIPAddress(ctx context.Context, ipAddress string,
 	return count > 0, err
 }
 
+// HostSortColumns are the fields hosts may be sorted by
+var HostSortColumns = sanitize.SortColumns{
+	"hostname":  "hostname",
+	"ipAddress": "ip_address",
+	"status":    "status",
+	"createdAt": "created_at",
+	"updatedAt": "updated_at",
+}
+
 // List returns a paginated list of hosts with optional filters
 func (r *HostRepository) List(ctx context.Context, filter *HostFilter) ([]*model.Host, int64, error) {
 	var hosts []*model.Host
@@ -75,10 +85,10 @@ func (r *HostRepository) List(ctx context.Context, filter *HostFilter) ([]*model
 			query = query.Where("status = ?", filter.Status)
 		}
 		if filter.Hostname != "" {
-			query = query.Where("hostname ILIKE ?", "%"+filter.Hostname+"%")
+			query = query.Where("hostname ILIKE ?", sanitize.Contains(filter.Hostname))
 		}
 		if filter.IPAddress != "" {
-			query = query.Where("ip_address ILIKE ?", "%"+filter.IPAddress+"%")
+			query = query.Where("ip_address ILIKE ?", sanitize.Contains(filter.IPAddress))
 		}
 		if filter.RegisteredBy != nil {
 			query = query.Where("registered_by = ?", filter.RegisteredBy)
@@ -109,9 +119,9 @@ func (r *HostRepository) List(ctx context.Context, filter *HostFilter) ([]*model
 		}
 		// Apply sorting
 		if filter.SortBy != "" {
-			order := filter.SortBy
-			if filter.SortDesc {
-				order += " DESC"
+			order, err := HostSortColumns.Order(filter.SortBy, filter.SortDesc)
+			if err != nil {
+				return nil, 0, err
 			}
 			query = query.Order(order)
 		}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+)
+
+// DataSourceRepository handles Prometheus data source database operations
+type DataSourceRepository struct {
+	db *gorm.DB
+}
+
+// NewDataSourceRepository creates a new DataSourceRepository
+func NewDataSourceRepository(db *gorm.DB) *DataSourceRepository {
+	return &DataSourceRepository{db: db}
+}
+
+// DataSourceFilter represents filter options for listing data sources
+type DataSourceFilter struct {
+	UserID    uuid.UUID
+	ClusterID *uuid.UUID
+	Status    string
+	Tags      string // Selector over the data sources' tags; see WithTags
+	Page      int
+	PageSize  int
+}
+
+// Create creates a new data source
+func (r *DataSourceRepository) Create(ctx context.Context, dataSource *model.PrometheusDataSource) error {
+	return r.db.WithContext(ctx).Create(dataSource).Error
+}
+
+// FindOwned finds a data source by ID that belongs to userID, with its cluster
+func (r *DataSourceRepository) FindOwned(ctx context.Context, id, userID uuid.UUID) (*model.PrometheusDataSource, error) {
+	var dataSource model.PrometheusDataSource
+	if err := r.db.WithContext(ctx).Preload("Cluster").Where("id = ? AND user_id = ?", id, userID).First(&dataSource).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &dataSource, nil
+}
+
+// NameTaken reports whether another of the user's data sources is called name
+func (r *DataSourceRepository) NameTaken(ctx context.Context, userID uuid.UUID, name string, except uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.PrometheusDataSource{}).
+		Where("user_id = ? AND name = ? AND id <> ?", userID, name, except).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// List returns a page of the user's data sources with their clusters, newest
+// first, and how many match
+func (r *DataSourceRepository) List(ctx context.Context, filter *DataSourceFilter) ([]model.PrometheusDataSource, int64, error) {
+	query := r.db.WithContext(ctx).Model(&model.PrometheusDataSource{}).Where("user_id = ?", filter.UserID)
+	if filter.ClusterID != nil {
+		query = query.Where("cluster_id = ?", *filter.ClusterID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	query, err := WithTags(query, model.TagResourceDataSource, filter.Tags)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var dataSources []model.PrometheusDataSource
+	if err := paginate(query.Preload("Cluster").Order("created_at DESC"), filter.Page, filter.PageSize).Find(&dataSources).Error; err != nil {
+		return nil, 0, err
+	}
+	return dataSources, total, nil
+}
+
+// Update writes the named fields of an existing data source
+func (r *DataSourceRepository) Update(ctx context.Context, dataSource *model.PrometheusDataSource, fields ...string) error {
+	return updateFields(r.db.WithContext(ctx), dataSource, fields)
+}
+
+// Delete deletes a data source
+func (r *DataSourceRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Delete(&model.PrometheusDataSource{}, "id = ?", id).Error
+}
+
+// PrometheusAlertRuleRepository handles Prometheus alerting rule database operations
+type PrometheusAlertRuleRepository struct {
+	db *gorm.DB
+}
+
+// NewPrometheusAlertRuleRepository creates a new PrometheusAlertRuleRepository
+func NewPrometheusAlertRuleRepository(db *gorm.DB) *PrometheusAlertRuleRepository {
+	return &PrometheusAlertRuleRepository{db: db}
+}
+
+// PrometheusAlertRuleFilter represents filter options for listing Prometheus alerting rules
+type PrometheusAlertRuleFilter struct {
+	UserID       uuid.UUID
+	DataSourceID *uuid.UUID
+	ClusterID    *uuid.UUID
+	Severity     string
+	Enabled      *bool
+	Page         int
+	PageSize     int
+}
+
+// Create creates a new alerting rule
+func (r *PrometheusAlertRuleRepository) Create(ctx context.Context, rule *model.PrometheusAlertRule) error {
+	return r.db.WithContext(ctx).Create(rule).Error
+}
+
+// FindOwned finds an alerting rule by ID that belongs to userID, with its data
+// source and cluster
+func (r *PrometheusAlertRuleRepository) FindOwned(ctx context.Context, id, userID uuid.UUID) (*model.PrometheusAlertRule, error) {
+	var rule model.PrometheusAlertRule
+	err := r.db.WithContext(ctx).Preload("DataSource").Preload("Cluster").
+		Where("id = ? AND user_id = ?", id, userID).
+		First(&rule).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &rule, nil
+}
+
+// NameTaken reports whether another rule of the data source is called name
+func (r *PrometheusAlertRuleRepository) NameTaken(ctx context.Context, dataSourceID uuid.UUID, name string, except uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.PrometheusAlertRule{}).
+		Where("data_source_id = ? AND name = ? AND id <> ?", dataSourceID, name, except).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// List returns a page of the user's alerting rules with their data sources and
+// clusters, newest first, and how many match
+func (r *PrometheusAlertRuleRepository) List(ctx context.Context, filter *PrometheusAlertRuleFilter) ([]model.PrometheusAlertRule, int64, error) {
+	query := r.db.WithContext(ctx).Model(&model.PrometheusAlertRule{}).Where("user_id = ?", filter.UserID)
+	if filter.DataSourceID != nil {
+		query = query.Where("data_source_id = ?", *filter.DataSourceID)
+	}
+	if filter.ClusterID != nil {
+		query = query.Where("cluster_id = ?", *filter.ClusterID)
+	}
+	if filter.Severity != "" {
+		query = query.Where("severity = ?", filter.Severity)
+	}
+	if filter.Enabled != nil {
+		query = query.Where("enabled = ?", *filter.Enabled)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var rules []model.PrometheusAlertRule
+	query = query.Preload("DataSource").Preload("Cluster").Order("created_at DESC")
+	if err := paginate(query, filter.Page, filter.PageSize).Find(&rules).Error; err != nil {
+		return nil, 0, err
+	}
+	return rules, total, nil
+}
+
+// Update writes the named fields of an existing alerting rule
+func (r *PrometheusAlertRuleRepository) Update(ctx context.Context, rule *model.PrometheusAlertRule, fields ...string) error {
+	return updateFields(r.db.WithContext(ctx), rule, fields)
+}
+
+// Delete deletes an alerting rule
+func (r *PrometheusAlertRuleRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Delete(&model.PrometheusAlertRule{}, "id = ?", id).Error
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// maxSlowestQueries is how many of its slowest statements a request keeps
+const maxSlowestQueries = 5
+
+// QueryTiming is a statement and how long it ran. SQL holds placeholders in
+// place of the statement's parameters, which may be secrets.
+type QueryTiming struct {
+	SQL      string        `json:"sql"`
+	Rows     int64         `json:"rows"`
+	Duration time.Duration `json:"duration"`
+	Err      error         `json:"-"`
+}
+
+// QueryTimings collects the statements run with a request's context: how many
+// ran, for how long in total, and the slowest of them
+type QueryTimings struct {
+	mu      sync.Mutex
+	count   int
+	total   time.Duration
+	slowest []QueryTiming // Slowest first
+}
+
+type queryTimingsKey struct{}
+
+// WithQueryTimings returns a context the statements run with are recorded on
+func WithQueryTimings(ctx context.Context) (context.Context, *QueryTimings) {
+	timings := &QueryTimings{}
+	return context.WithValue(ctx, queryTimingsKey{}, timings), timings
+}
+
+func queryTimingsOf(ctx context.Context) *QueryTimings {
+	if ctx == nil {
+		return nil
+	}
+	timings, _ := ctx.Value(queryTimingsKey{}).(*QueryTimings)
+	return timings
+}
+
+// Summary returns how many statements ran, their total duration and the
+// slowest of them, slowest first
+func (t *QueryTimings) Summary() (count int, total time.Duration, slowest []QueryTiming) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.count, t.total, append([]QueryTiming(nil), t.slowest...)
+}
+
+func (t *QueryTimings) add(q QueryTiming) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.count++
+	t.total += q.Duration
+	if len(t.slowest) == maxSlowestQueries && q.Duration <= t.slowest[len(t.slowest)-1].Duration {
+		return
+	}
+	t.slowest = append(t.slowest, q)
+	sort.SliceStable(t.slowest, func(i, j int) bool { return t.slowest[i].Duration > t.slowest[j].Duration })
+	if len(t.slowest) > maxSlowestQueries {
+		t.slowest = t.slowest[:maxSlowestQueries]
+	}
+}
+
+// TimeQueries records every statement run through gdb, or a session derived
+// from it afterwards, on the QueryTimings of the statement's context, and
+// passes those running for threshold or longer to slow. Only statements run
+// with a request's context, through WithContext, count towards the request.
+// Statements are logged by GORM without their parameters from then on.
+func TimeQueries(gdb *gorm.DB, threshold time.Duration, slow func(ctx context.Context, q QueryTiming)) {
+	gdb.Logger = &queryTimer{Interface: gdb.Logger, threshold: threshold, slow: slow}
+}
+
+// queryTimer is the GORM logger TimeQueries installs in front of the one it
+// found
+type queryTimer struct {
+	logger.Interface
+	threshold time.Duration
+	slow      func(ctx context.Context, q QueryTiming)
+}
+
+func (t *queryTimer) LogMode(level logger.LogLevel) logger.Interface {
+	return &queryTimer{Interface: t.Interface.LogMode(level), threshold: t.threshold, slow: t.slow}
+}
+
+func (t *queryTimer) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	t.Interface.Trace(ctx, begin, fc, err)
+
+	elapsed := time.Since(begin)
+	timings := queryTimingsOf(ctx)
+	isSlow := t.threshold > 0 && elapsed >= t.threshold && t.slow != nil
+	if timings == nil && !isSlow {
+		return
+	}
+
+	sql, rows := fc()
+	q := QueryTiming{SQL: sql, Rows: rows, Duration: elapsed, Err: err}
+	if timings != nil {
+		timings.add(q)
+	}
+	if isSlow {
+		t.slow(ctx, q)
+	}
+}
+
+// ParamsFilter leaves the parameters out of the statements GORM explains to
+// loggers
+func (t *queryTimer) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotFound is returned by the aggregate repositories when a record does not
+// exist, so callers need not know about GORM
+var ErrNotFound = errors.New("record not found")
+
+// notFound translates GORM's missing record error to ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// paginate applies page and pageSize to query; a pageSize of 0 returns every record
+func paginate(query *gorm.DB, page, pageSize int) *gorm.DB {
+	if pageSize <= 0 {
+		return query
+	}
+	if page < 1 {
+		page = 1
+	}
+	return query.Limit(pageSize).Offset((page - 1) * pageSize)
+}
+
+// updateFields writes the named struct fields of value, and its update time,
+// leaving other columns and loaded relations alone so concurrent updates of
+// other fields are not overwritten
+func updateFields(tx *gorm.DB, value interface{}, fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	fields = append(fields, "UpdatedAt")
+	return tx.Model(value).Select(fields).Omit(clause.Associations).Updates(value).Error
+}
+
+// DeleteWithChildren deletes record and the rows of each child model whose
+// column references it in one transaction, so a failure leaves no orphans and
+// no half-deleted parent. record must have its primary key set.
+func DeleteWithChildren(gdb *gorm.DB, record interface{}, column string, id interface{}, children ...interface{}) error {
+	return gdb.Transaction(func(tx *gorm.DB) error {
+		for _, child := range children {
+			if err := tx.Where(column+" = ?", id).Delete(child).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(record).Error
+	})
+}
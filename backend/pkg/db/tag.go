@@ -0,0 +1,227 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wangjialin/myops/pkg/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// ErrInvalidTagSelector is returned for tag selectors that do not parse or use
+// an operator lists cannot be filtered by
+var ErrInvalidTagSelector = errors.New("invalid tag selector")
+
+// taggedModels maps each kind of taggable resource to its model. Every table has
+// id and user_id columns.
+var taggedModels = map[model.TagResourceType]interface{}{
+	model.TagResourceCluster:     &model.K8sCluster{},
+	model.TagResourceDataSource:  &model.PrometheusDataSource{},
+	model.TagResourceDashboard:   &model.GrafanaDashboard{},
+	model.TagResourceAlertRule:   &model.AlertRule{},
+	model.TagResourceHelmRelease: &model.HelmRelease{},
+}
+
+// TagRepository handles resource tag database operations
+type TagRepository struct {
+	db *gorm.DB
+}
+
+// NewTagRepository creates a new TagRepository
+func NewTagRepository(db *gorm.DB) *TagRepository {
+	return &TagRepository{db: db}
+}
+
+// ParseTagSelector parses a label selector over tags, such as
+// "env=prod,team in (payments,search),!legacy". The gt and lt operators are
+// rejected since tag values are not compared as numbers. An empty selector has
+// no requirements.
+func ParseTagSelector(selector string) (labels.Requirements, error) {
+	if selector == "" {
+		return nil, nil
+	}
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTagSelector, err)
+	}
+	requirements, _ := parsed.Requirements()
+	for _, requirement := range requirements {
+		if op := requirement.Operator(); op == selection.GreaterThan || op == selection.LessThan {
+			return nil, fmt.Errorf("%w: operator %s is not supported", ErrInvalidTagSelector, op)
+		}
+	}
+	return requirements, nil
+}
+
+// WithTags limits query, over the table of resourceType, to the resources whose
+// tags match selector; see ParseTagSelector. Like label selectors, != and notin
+// also match resources without the key. An empty selector leaves query alone.
+func WithTags(query *gorm.DB, resourceType model.TagResourceType, selector string) (*gorm.DB, error) {
+	requirements, err := ParseTagSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, requirement := range requirements {
+		tagged := query.Session(&gorm.Session{NewDB: true}).Model(&model.ResourceTag{}).
+			Select("resource_id").
+			Where("resource_type = ? AND key = ?", resourceType, requirement.Key())
+		values := requirement.Values().List()
+		switch requirement.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In:
+			query = query.Where("id IN (?)", tagged.Where("value IN ?", values))
+		case selection.NotEquals, selection.NotIn:
+			query = query.Where("id NOT IN (?)", tagged.Where("value IN ?", values))
+		case selection.Exists:
+			query = query.Where("id IN (?)", tagged)
+		case selection.DoesNotExist:
+			query = query.Where("id NOT IN (?)", tagged)
+		}
+	}
+	return query, nil
+}
+
+// FindMany returns the tags of resources by resource ID. Resources without tags
+// are left out.
+func (r *TagRepository) FindMany(ctx context.Context, resourceType model.TagResourceType, ids []uuid.UUID) (map[uuid.UUID]map[string]string, error) {
+	tags := make(map[uuid.UUID]map[string]string)
+	if len(ids) == 0 {
+		return tags, nil
+	}
+	var rows []model.ResourceTag
+	if err := r.db.WithContext(ctx).
+		Where("resource_type = ? AND resource_id IN ?", resourceType, ids).
+		Order("key").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if tags[row.ResourceID] == nil {
+			tags[row.ResourceID] = make(map[string]string)
+		}
+		tags[row.ResourceID][row.Key] = row.Value
+	}
+	return tags, nil
+}
+
+// Resolve returns which of ids are existing resources of resourceType, owned by
+// owner unless it is nil
+func (r *TagRepository) Resolve(ctx context.Context, resourceType model.TagResourceType, ids []uuid.UUID, owner *uuid.UUID) ([]uuid.UUID, error) {
+	resource, ok := taggedModels[resourceType]
+	if !ok {
+		return nil, fmt.Errorf("resources of type %q cannot be tagged", resourceType)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	query := r.db.WithContext(ctx).Model(resource).Where("id IN ?", ids)
+	if owner != nil {
+		query = query.Where("user_id = ?", *owner)
+	}
+	var found []uuid.UUID
+	err := query.Pluck("id", &found).Error
+	return found, err
+}
+
+// Replace replaces every tag of a resource
+func (r *TagRepository) Replace(ctx context.Context, resourceType model.TagResourceType, id uuid.UUID, tags map[string]string, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("resource_type = ? AND resource_id = ?", resourceType, id).Delete(&model.ResourceTag{}).Error; err != nil {
+			return err
+		}
+		return upsertTags(tx, resourceType, []uuid.UUID{id}, tags, userID)
+	})
+}
+
+// Apply sets the tags in add and removes the keys in remove on every resource in
+// ids, in one transaction
+func (r *TagRepository) Apply(ctx context.Context, resourceType model.TagResourceType, ids []uuid.UUID, add map[string]string, remove []string, userID uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(remove) > 0 {
+			if err := tx.Where("resource_type = ? AND resource_id IN ? AND key IN ?", resourceType, ids, remove).
+				Delete(&model.ResourceTag{}).Error; err != nil {
+				return err
+			}
+		}
+		return upsertTags(tx, resourceType, ids, add, userID)
+	})
+}
+
+// upsertTags sets tags on every resource in ids, overwriting existing values
+func upsertTags(tx *gorm.DB, resourceType model.TagResourceType, ids []uuid.UUID, tags map[string]string, userID uuid.UUID) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	rows := make([]model.ResourceTag, 0, len(ids)*len(tags))
+	for _, id := range ids {
+		for key, value := range tags {
+			rows = append(rows, model.ResourceTag{ResourceType: resourceType, ResourceID: id, Key: key, Value: value, CreatedBy: &userID})
+		}
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "resource_type"}, {Name: "resource_id"}, {Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"value": gorm.Expr("EXCLUDED.value"), "updated_at": time.Now()}),
+	}).CreateInBatches(rows, 500).Error
+}
+
+// Keys returns the tag keys on the resources a user owns, with their values and
+// how many resources have each, optionally for one kind of resource only
+func (r *TagRepository) Keys(ctx context.Context, userID uuid.UUID, resourceType model.TagResourceType) ([]model.TagKey, error) {
+	type keyValue struct {
+		Key   string
+		Value string
+		Count int64
+	}
+	counts := make(map[string]*model.TagKey)
+	for _, kind := range model.TagResourceTypes {
+		if resourceType != "" && kind != resourceType {
+			continue
+		}
+		owned := r.db.WithContext(ctx).Model(taggedModels[kind]).Select("id").Where("user_id = ?", userID)
+		var rows []keyValue
+		if err := r.db.WithContext(ctx).Model(&model.ResourceTag{}).
+			Select("key, value, COUNT(*) AS count").
+			Where("resource_type = ? AND resource_id IN (?)", kind, owned).
+			Group("key, value").
+			Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			key := counts[row.Key]
+			if key == nil {
+				key = &model.TagKey{Key: row.Key, Values: []string{}}
+				counts[row.Key] = key
+			}
+			key.Count += row.Count
+			if !containsString(key.Values, row.Value) {
+				key.Values = append(key.Values, row.Value)
+			}
+		}
+	}
+
+	keys := make([]model.TagKey, 0, len(counts))
+	for _, key := range counts {
+		sort.Strings(key.Values)
+		keys = append(keys, *key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+	return keys, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -41,4 +41,7 @@ var (
 	ErrInvalidEmail   = NewError("INVALID_EMAIL", "邮箱格式无效")
 	ErrInvalidCredentials = NewError("INVALID_CREDENTIALS", "用户名或密码错误")
 	ErrUnauthorized   = NewError("UNAUTHENTICATED", "未认证")
+	ErrUserDisabled   = NewError("USER_DISABLED", "用户已被禁用")
+	ErrAccountLocked  = NewError("ACCOUNT_LOCKED", "登录失败次数过多，账户已被临时锁定")
+	ErrInvalidMFACode = NewError("INVALID_MFA_CODE", "验证码无效或已过期")
 )
@@ -0,0 +1,260 @@
+// Package k8s provides short-lived kubeconfigs scoped to a service account
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// AccessNamespace holds the service accounts scoped kubeconfigs authenticate as
+const AccessNamespace = "myops-access"
+
+const (
+	accessManagedByLabel  = "app.kubernetes.io/managed-by"
+	accessManagedBy       = "myops"
+	accessUserAnnotation  = "myops.io/user"
+	accessScopeAnnotation = "myops.io/scope"
+)
+
+// ScopedAccessRequest describes a kubeconfig to issue. The service account Name
+// in AccessNamespace is bound to a Role granting the permissions in Namespace,
+// or to a ClusterRole when Namespace is empty. Issuing the same Name again
+// replaces the permissions of every token issued for it.
+type ScopedAccessRequest struct {
+	Name        string
+	Namespace   string
+	User        string // Recorded on the service account, for cluster admins
+	Permissions []RolePermission
+	TTL         time.Duration
+}
+
+// ScopedAccess is an issued kubeconfig and when its token expires
+type ScopedAccess struct {
+	Kubeconfig     []byte
+	ServiceAccount string // namespace/name
+	ExpiresAt      time.Time
+}
+
+// IssueScopedAccess creates or updates the service account, role and binding of
+// req and returns a kubeconfig with a token for the account that expires after
+// req.TTL. Clusters only reachable through a connector tunnel cannot be issued
+// kubeconfigs, since the tunnel only serves the platform.
+func (c *ClusterClient) IssueScopedAccess(ctx context.Context, req *ScopedAccessRequest) (*ScopedAccess, error) {
+	if _, tunneled := tunnelDial(c.config.Host); tunneled {
+		return nil, fmt.Errorf("the cluster is only reachable through its connector")
+	}
+	if len(req.Permissions) == 0 {
+		return nil, fmt.Errorf("at least one permission is required")
+	}
+
+	meta := metav1.ObjectMeta{
+		Name:        req.Name,
+		Labels:      map[string]string{accessManagedByLabel: accessManagedBy},
+		Annotations: map[string]string{accessUserAnnotation: req.User, accessScopeAnnotation: req.Namespace},
+	}
+	if err := c.ensureAccessNamespace(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.applyAccessServiceAccount(ctx, meta); err != nil {
+		return nil, err
+	}
+	if req.Namespace == "" {
+		err := c.applyAccessClusterRole(ctx, meta, policyRules(req.Permissions))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		meta.Namespace = req.Namespace
+		err := c.applyAccessRole(ctx, meta, policyRules(req.Permissions))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	seconds := int64(req.TTL / time.Second)
+	token, err := c.clientset.CoreV1().ServiceAccounts(AccessNamespace).CreateToken(ctx, req.Name, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &seconds},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token: %w", err)
+	}
+
+	kubeconfig, err := c.scopedKubeconfig(req, token.Status.Token)
+	if err != nil {
+		return nil, err
+	}
+	return &ScopedAccess{
+		Kubeconfig:     kubeconfig,
+		ServiceAccount: AccessNamespace + "/" + req.Name,
+		ExpiresAt:      token.Status.ExpirationTimestamp.Time,
+	}, nil
+}
+
+// RevokeScopedAccess deletes the service account, role and binding issued under
+// name. Deleting the service account invalidates every token issued for it.
+func (c *ClusterClient) RevokeScopedAccess(ctx context.Context, name, namespace string) error {
+	rbac := c.clientset.RbacV1()
+	var err error
+	if namespace == "" {
+		err = ignoreNotFound(rbac.ClusterRoleBindings().Delete(ctx, name, metav1.DeleteOptions{}))
+		if err == nil {
+			err = ignoreNotFound(rbac.ClusterRoles().Delete(ctx, name, metav1.DeleteOptions{}))
+		}
+	} else {
+		err = ignoreNotFound(rbac.RoleBindings(namespace).Delete(ctx, name, metav1.DeleteOptions{}))
+		if err == nil {
+			err = ignoreNotFound(rbac.Roles(namespace).Delete(ctx, name, metav1.DeleteOptions{}))
+		}
+	}
+	if err == nil {
+		err = ignoreNotFound(c.clientset.CoreV1().ServiceAccounts(AccessNamespace).Delete(ctx, name, metav1.DeleteOptions{}))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke access: %w", err)
+	}
+	return nil
+}
+
+func (c *ClusterClient) ensureAccessNamespace(ctx context.Context) error {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   AccessNamespace,
+		Labels: map[string]string{accessManagedByLabel: accessManagedBy},
+	}}
+	_, err := c.clientset.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create namespace %s: %w", AccessNamespace, err)
+	}
+	return nil
+}
+
+func (c *ClusterClient) applyAccessServiceAccount(ctx context.Context, meta metav1.ObjectMeta) error {
+	accounts := c.clientset.CoreV1().ServiceAccounts(AccessNamespace)
+	meta.Namespace = AccessNamespace
+	automount := false
+	account := &corev1.ServiceAccount{ObjectMeta: meta, AutomountServiceAccountToken: &automount}
+
+	existing, err := accounts.Get(ctx, meta.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := accounts.Create(ctx, account, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create service account: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get service account: %w", err)
+	}
+	existing.Labels = meta.Labels
+	existing.Annotations = meta.Annotations
+	if _, err := accounts.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update service account: %w", err)
+	}
+	return nil
+}
+
+func (c *ClusterClient) applyAccessRole(ctx context.Context, meta metav1.ObjectMeta, rules []rbacv1.PolicyRule) error {
+	roles := c.clientset.RbacV1().Roles(meta.Namespace)
+	existing, err := roles.Get(ctx, meta.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if _, err := roles.Create(ctx, &rbacv1.Role{ObjectMeta: meta, Rules: rules}, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create role: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to get role: %w", err)
+	default:
+		existing.Labels, existing.Annotations, existing.Rules = meta.Labels, meta.Annotations, rules
+		if _, err := roles.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update role: %w", err)
+		}
+	}
+
+	bindings := c.clientset.RbacV1().RoleBindings(meta.Namespace)
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: meta,
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: meta.Name},
+		Subjects:   accessSubjects(meta.Name),
+	}
+	if _, err := bindings.Get(ctx, meta.Name, metav1.GetOptions{}); apierrors.IsNotFound(err) {
+		if _, err := bindings.Create(ctx, binding, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create role binding: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to get role binding: %w", err)
+	}
+	return nil
+}
+
+func (c *ClusterClient) applyAccessClusterRole(ctx context.Context, meta metav1.ObjectMeta, rules []rbacv1.PolicyRule) error {
+	roles := c.clientset.RbacV1().ClusterRoles()
+	existing, err := roles.Get(ctx, meta.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if _, err := roles.Create(ctx, &rbacv1.ClusterRole{ObjectMeta: meta, Rules: rules}, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create cluster role: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to get cluster role: %w", err)
+	default:
+		existing.Labels, existing.Annotations, existing.Rules = meta.Labels, meta.Annotations, rules
+		if _, err := roles.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update cluster role: %w", err)
+		}
+	}
+
+	bindings := c.clientset.RbacV1().ClusterRoleBindings()
+	binding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: meta,
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: meta.Name},
+		Subjects:   accessSubjects(meta.Name),
+	}
+	if _, err := bindings.Get(ctx, meta.Name, metav1.GetOptions{}); apierrors.IsNotFound(err) {
+		if _, err := bindings.Create(ctx, binding, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create cluster role binding: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to get cluster role binding: %w", err)
+	}
+	return nil
+}
+
+// accessSubjects binds a role to the access service account name
+func accessSubjects(name string) []rbacv1.Subject {
+	return []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: name, Namespace: AccessNamespace}}
+}
+
+// scopedKubeconfig renders a kubeconfig reaching the cluster the client does,
+// authenticating with token
+func (c *ClusterClient) scopedKubeconfig(req *ScopedAccessRequest, token string) ([]byte, error) {
+	config := clientcmdapi.NewConfig()
+	config.Clusters[req.Name] = &clientcmdapi.Cluster{
+		Server:                   c.config.Host,
+		CertificateAuthorityData: c.config.CAData,
+		InsecureSkipTLSVerify:    c.config.Insecure,
+		TLSServerName:            c.config.ServerName,
+	}
+	config.AuthInfos[req.Name] = &clientcmdapi.AuthInfo{Token: token}
+	config.Contexts[req.Name] = &clientcmdapi.Context{Cluster: req.Name, AuthInfo: req.Name, Namespace: req.Namespace}
+	config.CurrentContext = req.Name
+
+	data, err := clientcmd.Write(*config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render kubeconfig: %w", err)
+	}
+	return data, nil
+}
+
+func ignoreNotFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,355 @@
+// Package k8s provides an informer cache of the pods, deployments and services
+// of a cluster that list and get reads can be served from
+package k8s
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Where a read was served from
+const (
+	CacheSourceCache   = "cache"
+	CacheSourceCluster = "cluster"
+)
+
+// Reasons a read bypassed the cache of its cluster
+const (
+	CacheDisabled          = "disabled"           // Caching is off, or the cluster is not connected
+	CacheCold              = "cold"               // The cache has not finished its initial list
+	CacheNamespaceExcluded = "namespace_excluded" // The namespace is not among those cached
+	CacheOverLimit         = "over_limit"         // The cluster has more objects than the cache may hold
+	CacheStale             = "stale"              // The cache's watches have been failing
+)
+
+// cacheStaleAfter is how long a watch may keep failing before its cache is
+// no longer read from. Reflectors relist on their own well within it.
+const cacheStaleAfter = 30 * time.Second
+
+// CacheFreshness describes where a read was served from and, for cache
+// reads, how current the cache is
+type CacheFreshness struct {
+	Source          string     `json:"source"`
+	Reason          string     `json:"reason,omitempty"`          // Why the cache was bypassed
+	SyncedAt        *time.Time `json:"syncedAt,omitempty"`        // When the cache finished its initial list
+	LastChangeAt    *time.Time `json:"lastChangeAt,omitempty"`    // The last change the cache received
+	ResourceVersion string     `json:"resourceVersion,omitempty"` // The version the kind was last synced at
+}
+
+// CacheBypass is the freshness of a read served by the cluster
+func CacheBypass(reason string) *CacheFreshness {
+	return &CacheFreshness{Source: CacheSourceCluster, Reason: reason}
+}
+
+// ClusterCache holds the pods, deployments and services of a cluster in
+// informer caches, of every namespace or only some. It stops itself once it
+// holds more than its object limit.
+type ClusterCache struct {
+	shards     map[string]*cacheShard // By namespace; "" holds every namespace
+	maxObjects int
+	stop       chan struct{}
+
+	mu         sync.Mutex
+	objects    int
+	syncedAt   time.Time
+	lastChange time.Time
+	failing    map[cache.SharedIndexInformer]cacheWatchError
+	overLimit  bool
+	stopped    bool
+}
+
+// cacheShard holds the informers of one namespace, or of all of them
+type cacheShard struct {
+	factory     informers.SharedInformerFactory
+	pods        cache.SharedIndexInformer
+	deployments cache.SharedIndexInformer
+	services    cache.SharedIndexInformer
+}
+
+func (s *cacheShard) informers() []cache.SharedIndexInformer {
+	return []cache.SharedIndexInformer{s.pods, s.deployments, s.services}
+}
+
+// cacheWatchError is a watch failing since at, when its informer was at
+// resourceVersion
+type cacheWatchError struct {
+	at              time.Time
+	resourceVersion string
+}
+
+// NewClusterCache creates a cache of namespaces, or of every namespace when
+// none are given, holding at most maxObjects objects; 0 means no limit.
+func (c *ClusterClient) NewClusterCache(namespaces []string, maxObjects int) *ClusterCache {
+	cc := &ClusterCache{
+		shards:     make(map[string]*cacheShard),
+		maxObjects: maxObjects,
+		stop:       make(chan struct{}),
+		failing:    make(map[cache.SharedIndexInformer]cacheWatchError),
+	}
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	for _, ns := range namespaces {
+		if _, ok := cc.shards[ns]; ok {
+			continue
+		}
+		factory := informers.NewSharedInformerFactoryWithOptions(c.clientset, 0, informers.WithNamespace(ns))
+		cc.shards[ns] = &cacheShard{
+			factory:     factory,
+			pods:        factory.Core().V1().Pods().Informer(),
+			deployments: factory.Apps().V1().Deployments().Informer(),
+			services:    factory.Core().V1().Services().Informer(),
+		}
+	}
+	return cc
+}
+
+// Start lists and watches the cached kinds. It returns at once; reads are
+// served from the cache once every informer synced.
+func (cc *ClusterCache) Start() error {
+	for _, shard := range cc.shards {
+		for _, informer := range shard.informers() {
+			if err := informer.SetTransform(stripManagedFields); err != nil {
+				return err
+			}
+			if err := informer.SetWatchErrorHandlerWithContext(cc.watchErrorHandler(informer)); err != nil {
+				return err
+			}
+			if _, err := informer.AddEventHandler(cc.handler(informer)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, shard := range cc.shards {
+		shard.factory.Start(cc.stop)
+	}
+
+	go func() {
+		var synced []cache.InformerSynced
+		for _, shard := range cc.shards {
+			for _, informer := range shard.informers() {
+				synced = append(synced, informer.HasSynced)
+			}
+		}
+		if cache.WaitForCacheSync(cc.stop, synced...) {
+			cc.mu.Lock()
+			cc.syncedAt = time.Now()
+			cc.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// Stop stops the informers
+func (cc *ClusterCache) Stop() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.stopLocked()
+}
+
+func (cc *ClusterCache) stopLocked() {
+	if !cc.stopped {
+		cc.stopped = true
+		close(cc.stop)
+	}
+}
+
+// OverLimit reports whether the cache stopped itself because it would have
+// held more than its object limit
+func (cc *ClusterCache) OverLimit() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.overLimit
+}
+
+// Objects returns how many objects the cache holds
+func (cc *ClusterCache) Objects() int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.objects
+}
+
+// Pods lists the pods of a namespace from the cache. When the cache cannot
+// serve the read, the pods are nil and the freshness says why.
+func (cc *ClusterCache) Pods(namespace string) ([]PodInfo, *CacheFreshness) {
+	objects, freshness := cc.list(namespace, func(s *cacheShard) cache.SharedIndexInformer { return s.pods })
+	if objects == nil {
+		return nil, freshness
+	}
+	pods := make([]PodInfo, 0, len(objects))
+	for _, obj := range objects {
+		if pod, ok := obj.(*v1.Pod); ok {
+			pods = append(pods, podInfo(pod))
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, freshness
+}
+
+// Deployments lists the deployments of a namespace from the cache
+func (cc *ClusterCache) Deployments(namespace string) ([]DeploymentInfo, *CacheFreshness) {
+	objects, freshness := cc.list(namespace, func(s *cacheShard) cache.SharedIndexInformer { return s.deployments })
+	if objects == nil {
+		return nil, freshness
+	}
+	deployments := make([]DeploymentInfo, 0, len(objects))
+	for _, obj := range objects {
+		if dep, ok := obj.(*appsv1.Deployment); ok {
+			deployments = append(deployments, deploymentInfo(dep))
+		}
+	}
+	sort.Slice(deployments, func(i, j int) bool { return deployments[i].Name < deployments[j].Name })
+	return deployments, freshness
+}
+
+// Services lists the services of a namespace from the cache
+func (cc *ClusterCache) Services(namespace string) ([]ServiceInfo, *CacheFreshness) {
+	objects, freshness := cc.list(namespace, func(s *cacheShard) cache.SharedIndexInformer { return s.services })
+	if objects == nil {
+		return nil, freshness
+	}
+	services := make([]ServiceInfo, 0, len(objects))
+	for _, obj := range objects {
+		if svc, ok := obj.(*v1.Service); ok {
+			services = append(services, serviceInfo(svc))
+		}
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services, freshness
+}
+
+// PodLabels gets the labels of a pod from the cache. found is false when the
+// cache holds no such pod or cannot serve the read, as the freshness says.
+func (cc *ClusterCache) PodLabels(namespace, name string) (podLabels map[string]string, found bool, freshness *CacheFreshness) {
+	shard, freshness := cc.serve(namespace)
+	if shard == nil {
+		return nil, false, freshness
+	}
+	obj, exists, err := shard.pods.GetIndexer().GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, false, CacheBypass(CacheCold)
+	}
+	freshness.ResourceVersion = shard.pods.LastSyncResourceVersion()
+	pod, ok := obj.(*v1.Pod)
+	if !exists || !ok {
+		return nil, false, freshness
+	}
+	return pod.Labels, true, freshness
+}
+
+func (cc *ClusterCache) list(namespace string, informer func(*cacheShard) cache.SharedIndexInformer) ([]interface{}, *CacheFreshness) {
+	shard, freshness := cc.serve(namespace)
+	if shard == nil {
+		return nil, freshness
+	}
+	inf := informer(shard)
+	if namespace == "" {
+		freshness.ResourceVersion = inf.LastSyncResourceVersion()
+		return inf.GetStore().List(), freshness
+	}
+	objects, err := inf.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return nil, CacheBypass(CacheCold)
+	}
+	freshness.ResourceVersion = inf.LastSyncResourceVersion()
+	if objects == nil {
+		objects = []interface{}{}
+	}
+	return objects, freshness
+}
+
+// serve returns the shard of namespace when the cache can serve a read of
+// it, and the freshness of the read
+func (cc *ClusterCache) serve(namespace string) (*cacheShard, *CacheFreshness) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	switch {
+	case cc.overLimit:
+		return nil, CacheBypass(CacheOverLimit)
+	case cc.stopped:
+		return nil, CacheBypass(CacheDisabled)
+	case cc.syncedAt.IsZero():
+		return nil, CacheBypass(CacheCold)
+	}
+
+	shard, ok := cc.shards[""]
+	if !ok {
+		shard, ok = cc.shards[namespace]
+	}
+	if !ok {
+		return nil, CacheBypass(CacheNamespaceExcluded)
+	}
+
+	// A watch that recovered has moved on from the version it failed at
+	for _, informer := range shard.informers() {
+		failure, failing := cc.failing[informer]
+		if !failing {
+			continue
+		}
+		if informer.LastSyncResourceVersion() != failure.resourceVersion {
+			delete(cc.failing, informer)
+			continue
+		}
+		if time.Since(failure.at) > cacheStaleAfter {
+			return nil, CacheBypass(CacheStale)
+		}
+	}
+
+	syncedAt := cc.syncedAt
+	freshness := &CacheFreshness{Source: CacheSourceCache, SyncedAt: &syncedAt}
+	if !cc.lastChange.IsZero() {
+		lastChange := cc.lastChange
+		freshness.LastChangeAt = &lastChange
+	}
+	return shard, freshness
+}
+
+// handler counts the objects the cache holds and stops it past its limit
+func (cc *ClusterCache) handler(informer cache.SharedIndexInformer) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			cc.mu.Lock()
+			defer cc.mu.Unlock()
+			cc.objects++
+			if !isInInitialList {
+				cc.lastChange = time.Now()
+			}
+			if cc.maxObjects > 0 && cc.objects > cc.maxObjects && !cc.overLimit {
+				cc.overLimit = true
+				cc.stopLocked()
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			cc.mu.Lock()
+			defer cc.mu.Unlock()
+			cc.lastChange = time.Now()
+		},
+		DeleteFunc: func(obj interface{}) {
+			cc.mu.Lock()
+			defer cc.mu.Unlock()
+			cc.objects--
+			cc.lastChange = time.Now()
+		},
+	}
+}
+
+// watchErrorHandler records when the watch of an informer began failing
+func (cc *ClusterCache) watchErrorHandler(informer cache.SharedIndexInformer) cache.WatchErrorHandlerWithContext {
+	return func(ctx context.Context, r *cache.Reflector, err error) {
+		cache.DefaultWatchErrorHandler(ctx, r, err)
+
+		cc.mu.Lock()
+		defer cc.mu.Unlock()
+		if _, failing := cc.failing[informer]; !failing {
+			cc.failing[informer] = cacheWatchError{at: time.Now(), resourceVersion: informer.LastSyncResourceVersion()}
+		}
+	}
+}
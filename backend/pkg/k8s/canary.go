@@ -0,0 +1,359 @@
+// Package k8s provides the workloads and traffic routing of canary and
+// blue/green rollouts
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Canary rollout labels and annotations
+const (
+	// CanaryRolloutLabel marks the objects a rollout created with its ID
+	CanaryRolloutLabel = "myops.io/rollout"
+	// deploymentRevisionAnnotation is the revision the deployment controller sets on deployments and their replica sets
+	deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+	// ingress-nginx canary annotations
+	nginxCanaryAnnotation       = "nginx.ingress.kubernetes.io/canary"
+	nginxCanaryWeightAnnotation = "nginx.ingress.kubernetes.io/canary-weight"
+)
+
+// CanaryDeploymentSpec describes the deployment a rollout runs a new image in
+// next to a stable deployment
+type CanaryDeploymentSpec struct {
+	Namespace string
+	Stable    string // The deployment copied
+	Name      string
+	Container string
+	Image     string
+	Replicas  int32
+	Rollout   string // Set as CanaryRolloutLabel on the deployment and its pods
+}
+
+// CreateCanaryDeployment creates a copy of the stable deployment running the
+// new image. Its pods keep the stable pods' labels, so Services selecting the
+// stable pods select them too, and add CanaryRolloutLabel, which the copy's
+// selector requires.
+func (c *ClusterClient) CreateCanaryDeployment(ctx context.Context, spec *CanaryDeploymentSpec) error {
+	deployments := c.clientset.AppsV1().Deployments(spec.Namespace)
+	stable, err := deployments.Get(ctx, spec.Stable, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	canary := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      spec.Name,
+			Namespace: spec.Namespace,
+			Labels:    withLabel(stable.Labels, CanaryRolloutLabel, spec.Rollout),
+		},
+		Spec: *stable.Spec.DeepCopy(),
+	}
+	canary.Spec.Replicas = &spec.Replicas
+	canary.Spec.Paused = false
+	canary.Spec.Selector.MatchLabels = withLabel(canary.Spec.Selector.MatchLabels, CanaryRolloutLabel, spec.Rollout)
+	canary.Spec.Template.Labels = withLabel(canary.Spec.Template.Labels, CanaryRolloutLabel, spec.Rollout)
+
+	found := false
+	for i := range canary.Spec.Template.Spec.Containers {
+		if canary.Spec.Template.Spec.Containers[i].Name == spec.Container {
+			canary.Spec.Template.Spec.Containers[i].Image = spec.Image
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("deployment %s has no container %s", spec.Stable, spec.Container)
+	}
+
+	if _, err := deployments.Create(ctx, canary, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create canary deployment: %w", err)
+	}
+	return nil
+}
+
+// SetDeploymentReplicas sets the replica count of a deployment
+func (c *ClusterClient) SetDeploymentReplicas(ctx context.Context, namespace, name string, replicas int32) error {
+	deployments := c.clientset.AppsV1().Deployments(namespace)
+	scale, err := deployments.GetScale(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment scale: %w", err)
+	}
+	if scale.Spec.Replicas == replicas {
+		return nil
+	}
+	scale.Spec.Replicas = replicas
+	if _, err := deployments.UpdateScale(ctx, name, scale, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to scale deployment: %w", err)
+	}
+	return nil
+}
+
+// DeploymentPodTemplateHash returns the pod-template-hash label of the pods
+// of a deployment's current revision, which tells them apart from the pods of
+// other deployments sharing their labels
+func (c *ClusterClient) DeploymentPodTemplateHash(ctx context.Context, namespace, name string) (string, error) {
+	deployment, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get deployment: %w", err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return "", fmt.Errorf("invalid deployment selector: %w", err)
+	}
+	replicaSets, err := c.clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return "", fmt.Errorf("failed to list replica sets: %w", err)
+	}
+
+	revision := deployment.Annotations[deploymentRevisionAnnotation]
+	for _, rs := range replicaSets.Items {
+		owner := metav1.GetControllerOf(&rs)
+		if owner == nil || owner.UID != deployment.UID || rs.Annotations[deploymentRevisionAnnotation] != revision {
+			continue
+		}
+		if hash := rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; hash != "" {
+			return hash, nil
+		}
+	}
+	return "", fmt.Errorf("deployment %s has no replica set of revision %s", name, revision)
+}
+
+// CheckServiceSelects returns an error unless the Service selects the pods of
+// the deployment
+func (c *ClusterClient) CheckServiceSelects(ctx context.Context, namespace, service, deployment string) error {
+	svc, err := c.clientset.CoreV1().Services(namespace).Get(ctx, service, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get service: %w", err)
+	}
+	d, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, deployment, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return fmt.Errorf("service %s has no selector", service)
+	}
+	selector := labels.SelectorFromSet(withoutLabel(svc.Spec.Selector, appsv1.DefaultDeploymentUniqueLabelKey))
+	if !selector.Matches(labels.Set(d.Spec.Template.Labels)) {
+		return fmt.Errorf("service %s does not select the pods of deployment %s", service, deployment)
+	}
+	return nil
+}
+
+// PinServiceSelector restricts a Service to the pods with a pod-template-hash,
+// or lifts the restriction when hash is empty
+func (c *ClusterClient) PinServiceSelector(ctx context.Context, namespace, service, hash string) error {
+	var value interface{}
+	if hash != "" {
+		value = hash
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{appsv1.DefaultDeploymentUniqueLabelKey: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := c.clientset.CoreV1().Services(namespace).Patch(ctx, service, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to update service selector: %w", err)
+	}
+	return nil
+}
+
+// ApplyCanaryService creates or updates a Service with the ports of another
+// that selects only the pods of a rollout's canary deployment
+func (c *ClusterClient) ApplyCanaryService(ctx context.Context, namespace, name, from, rollout string) error {
+	services := c.clientset.CoreV1().Services(namespace)
+	stable, err := services.Get(ctx, from, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get service: %w", err)
+	}
+
+	ports := make([]corev1.ServicePort, 0, len(stable.Spec.Ports))
+	for _, port := range stable.Spec.Ports {
+		port.NodePort = 0
+		ports = append(ports, port)
+	}
+	rolloutLabels := map[string]string{CanaryRolloutLabel: rollout}
+	canary := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: rolloutLabels},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: rolloutLabels,
+			Ports:    ports,
+		},
+	}
+
+	existing, err := services.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := services.Create(ctx, canary, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create canary service: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get canary service: %w", err)
+	}
+	if existing.Labels[CanaryRolloutLabel] != rollout {
+		return fmt.Errorf("service %s exists and is not managed by this rollout", name)
+	}
+	existing.Spec.Selector = canary.Spec.Selector
+	existing.Spec.Ports = canary.Spec.Ports
+	if _, err := services.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update canary service: %w", err)
+	}
+	return nil
+}
+
+// CheckIngressRoutes returns an error unless the ingress routes to the Service
+func (c *ClusterClient) CheckIngressRoutes(ctx context.Context, namespace, ingress, service string) error {
+	ing, err := c.clientset.NetworkingV1().Ingresses(namespace).Get(ctx, ingress, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get ingress: %w", err)
+	}
+	if rerouteIngress(ing.Spec.DeepCopy(), service, service) == 0 {
+		return fmt.Errorf("ingress %s does not route to service %s", ingress, service)
+	}
+	return nil
+}
+
+// ApplyCanaryIngress creates or updates an ingress-nginx canary ingress: a copy
+// of an ingress routing to the canary Service instead of the stable one, which
+// the controller sends weight percent of the hosts' requests to
+func (c *ClusterClient) ApplyCanaryIngress(ctx context.Context, namespace, name, from, stableService, canaryService, rollout string, weight int) error {
+	ingresses := c.clientset.NetworkingV1().Ingresses(namespace)
+	stable, err := ingresses.Get(ctx, from, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get ingress: %w", err)
+	}
+
+	spec := stable.Spec.DeepCopy()
+	if rerouteIngress(spec, stableService, canaryService) == 0 {
+		return fmt.Errorf("ingress %s does not route to service %s", from, stableService)
+	}
+	annotations := make(map[string]string, len(stable.Annotations)+2)
+	for k, v := range stable.Annotations {
+		annotations[k] = v
+	}
+	annotations[nginxCanaryAnnotation] = "true"
+	annotations[nginxCanaryWeightAnnotation] = strconv.Itoa(weight)
+	canary := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      map[string]string{CanaryRolloutLabel: rollout},
+			Annotations: annotations,
+		},
+		Spec: *spec,
+	}
+
+	existing, err := ingresses.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := ingresses.Create(ctx, canary, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create canary ingress: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get canary ingress: %w", err)
+	}
+	if existing.Labels[CanaryRolloutLabel] != rollout {
+		return fmt.Errorf("ingress %s exists and is not managed by this rollout", name)
+	}
+	existing.Annotations = canary.Annotations
+	existing.Spec = canary.Spec
+	if _, err := ingresses.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update canary ingress: %w", err)
+	}
+	return nil
+}
+
+// DeleteCanaryResources deletes the ingress, deployment and Service a rollout
+// created, in that order. Empty names, objects already gone and objects of no
+// rollout of this ID are skipped.
+func (c *ClusterClient) DeleteCanaryResources(ctx context.Context, namespace, rollout, ingress, deployment, service string) error {
+	if ingress != "" {
+		ingresses := c.clientset.NetworkingV1().Ingresses(namespace)
+		existing, err := ingresses.Get(ctx, ingress, metav1.GetOptions{})
+		if err == nil && existing.Labels[CanaryRolloutLabel] == rollout {
+			err = ingresses.Delete(ctx, ingress, metav1.DeleteOptions{})
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete canary ingress: %w", err)
+		}
+	}
+	if deployment != "" {
+		deployments := c.clientset.AppsV1().Deployments(namespace)
+		existing, err := deployments.Get(ctx, deployment, metav1.GetOptions{})
+		if err == nil && existing.Labels[CanaryRolloutLabel] == rollout {
+			err = deployments.Delete(ctx, deployment, metav1.DeleteOptions{})
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete canary deployment: %w", err)
+		}
+	}
+	if service != "" {
+		services := c.clientset.CoreV1().Services(namespace)
+		existing, err := services.Get(ctx, service, metav1.GetOptions{})
+		if err == nil && existing.Labels[CanaryRolloutLabel] == rollout {
+			err = services.Delete(ctx, service, metav1.DeleteOptions{})
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete canary service: %w", err)
+		}
+	}
+	return nil
+}
+
+// rerouteIngress points the backends of an ingress spec at one Service to
+// another and returns how many it changed
+func rerouteIngress(spec *networkingv1.IngressSpec, from, to string) int {
+	changed := 0
+	reroute := func(backend *networkingv1.IngressBackend) {
+		if backend != nil && backend.Service != nil && backend.Service.Name == from {
+			backend.Service.Name = to
+			changed++
+		}
+	}
+	reroute(spec.DefaultBackend)
+	for i := range spec.Rules {
+		if spec.Rules[i].HTTP == nil {
+			continue
+		}
+		for j := range spec.Rules[i].HTTP.Paths {
+			reroute(&spec.Rules[i].HTTP.Paths[j].Backend)
+		}
+	}
+	return changed
+}
+
+// withLabel returns a copy of labels with key set to value
+func withLabel(set map[string]string, key, value string) map[string]string {
+	out := make(map[string]string, len(set)+1)
+	for k, v := range set {
+		out[k] = v
+	}
+	out[key] = value
+	return out
+}
+
+// withoutLabel returns a copy of labels without key
+func withoutLabel(set map[string]string, key string) map[string]string {
+	out := make(map[string]string, len(set))
+	for k, v := range set {
+		if k != key {
+			out[k] = v
+		}
+	}
+	return out
+}
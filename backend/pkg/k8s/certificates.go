@@ -0,0 +1,132 @@
+// Package k8s provides discovery of the TLS certificates of ingresses and kubeconfigs
+package k8s
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Certificate roles reported by KubeconfigCertificates
+const (
+	CertificateRoleClient    = "client-certificate"
+	CertificateRoleAuthority = "certificate-authority"
+)
+
+// IngressTLS is one TLS entry of an ingress with the certificate of its secret
+type IngressTLS struct {
+	Namespace   string
+	Ingress     string
+	SecretName  string
+	Hosts       []string
+	Certificate *x509.Certificate // The leaf of the secret's tls.crt; nil when it could not be read
+	Error       string            // Why the secret's certificate could not be read
+}
+
+// ListIngressTLS returns the TLS entries of the ingresses in all namespaces. The
+// certificate of each entry is read from its secret; entries whose secret is
+// missing or cannot be read are returned with an error instead.
+func (c *ClusterClient) ListIngressTLS(ctx context.Context) ([]IngressTLS, error) {
+	ingresses, err := c.clientset.NetworkingV1().Ingresses("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+
+	// Ingresses commonly share a wildcard certificate's secret
+	type secretCert struct {
+		cert *x509.Certificate
+		err  string
+	}
+	secrets := make(map[string]secretCert)
+	readSecret := func(namespace, name string) secretCert {
+		key := namespace + "/" + name
+		if cached, ok := secrets[key]; ok {
+			return cached
+		}
+		var result secretCert
+		secret, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			result.err = fmt.Sprintf("secret %s not found", key)
+		case err != nil:
+			result.err = fmt.Sprintf("failed to read secret %s: %v", key, err)
+		default:
+			certs, err := parseCertificates(secret.Data[v1.TLSCertKey])
+			if err != nil {
+				result.err = fmt.Sprintf("invalid %s in secret %s: %v", v1.TLSCertKey, key, err)
+			} else {
+				result.cert = certs[0]
+			}
+		}
+		secrets[key] = result
+		return result
+	}
+
+	var entries []IngressTLS
+	for _, ingress := range ingresses.Items {
+		for _, tls := range ingress.Spec.TLS {
+			entry := IngressTLS{
+				Namespace:  ingress.Namespace,
+				Ingress:    ingress.Name,
+				SecretName: tls.SecretName,
+				Hosts:      tls.Hosts,
+			}
+			if tls.SecretName == "" {
+				// The controller serves its default certificate
+				entry.Error = "no secret; served with the ingress controller's default certificate"
+			} else {
+				secret := readSecret(ingress.Namespace, tls.SecretName)
+				entry.Certificate, entry.Error = secret.cert, secret.err
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// KubeconfigCertificate is a certificate embedded in a kubeconfig
+type KubeconfigCertificate struct {
+	Context     string
+	Server      string
+	Role        string // client-certificate or certificate-authority
+	Certificate *x509.Certificate
+}
+
+// KubeconfigCertificates returns the client certificate and the cluster CA
+// certificates embedded for the kubeconfig's current context. Certificates
+// referenced by path cannot be read and are left out.
+func KubeconfigCertificates(kubeconfig []byte) ([]KubeconfigCertificate, error) {
+	info, err := InspectCredentials(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %w", err)
+	}
+	kubeContext := config.Contexts[info.Context]
+
+	var result []KubeconfigCertificate
+	if authInfo, ok := config.AuthInfos[kubeContext.AuthInfo]; ok && len(authInfo.ClientCertificateData) > 0 {
+		certs, err := parseCertificates(authInfo.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client-certificate-data: %w", err)
+		}
+		result = append(result, KubeconfigCertificate{Context: info.Context, Server: info.Server, Role: CertificateRoleClient, Certificate: certs[0]})
+	}
+	if cluster, ok := config.Clusters[kubeContext.Cluster]; ok && len(cluster.CertificateAuthorityData) > 0 {
+		certs, err := parseCertificates(cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate-authority-data: %w", err)
+		}
+		for _, cert := range certs {
+			result = append(result, KubeconfigCertificate{Context: info.Context, Server: info.Server, Role: CertificateRoleAuthority, Certificate: cert})
+		}
+	}
+	return result, nil
+}
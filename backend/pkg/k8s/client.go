@@ -7,7 +7,9 @@ import (
 	"io"
 	"time"
 
+	"github.com/wangjialin/myops/pkg/logging"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/api/core/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/client-go/kubernetes"
@@ -52,6 +54,14 @@ func NewClusterClient(config *ClusterConfig) (*ClusterClient, error) {
 		restConfig.Host = config.Endpoint
 	}
 
+	// Clusters onboarded through the in-cluster connector are reached over its tunnel
+	if dial, ok := tunnelDial(restConfig.Host); ok {
+		restConfig.Dial = dial
+	}
+
+	// Pass the correlation ID of the request a call is made for to the API server
+	restConfig.Wrap(logging.Transport)
+
 	// Create clientset
 	clientset, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
@@ -110,6 +120,7 @@ func (c *ClusterClient) GetNodes(ctx context.Context) ([]NodeInfo, error) {
 			CPUAllocatable:   node.Status.Allocatable.Cpu().String(),
 			MemoryAllocatable: node.Status.Allocatable.Memory().String(),
 			StorageAllocatable: node.Status.Allocatable.StorageEphemeral().String(),
+			Unschedulable:     node.Spec.Unschedulable,
 		}
 	}
 
@@ -214,45 +225,51 @@ func (c *ClusterClient) GetPods(ctx context.Context, namespace string) ([]PodInf
 	}
 
 	pods := make([]PodInfo, len(podList.Items))
-	for i, pod := range podList.Items {
-		// Get owner references
-		var ownerType, ownerName string
-		if len(pod.OwnerReferences) > 0 {
-			ownerType = string(pod.OwnerReferences[0].Kind)
-			ownerName = pod.OwnerReferences[0].Name
-		}
+	for i := range podList.Items {
+		pods[i] = podInfo(&podList.Items[i])
+	}
 
-		// Get restart count
-		restartCount := int32(0)
-		for _, cs := range pod.Status.ContainerStatuses {
-			restartCount += cs.RestartCount
-		}
+	return pods, nil
+}
 
-		// Check if pod is ready
-		ready := true
-		for _, cs := range pod.Status.ContainerStatuses {
-			if !cs.Ready {
-				ready = false
-				break
-			}
-		}
+// podInfo summarizes a pod
+func podInfo(pod *v1.Pod) PodInfo {
+	// Get owner references
+	var ownerType, ownerName string
+	if len(pod.OwnerReferences) > 0 {
+		ownerType = string(pod.OwnerReferences[0].Kind)
+		ownerName = pod.OwnerReferences[0].Name
+	}
 
-		pods[i] = PodInfo{
-			Name:         pod.Name,
-			Namespace:    pod.Namespace,
-			Status:       string(pod.Status.Phase),
-			Phase:        string(pod.Status.Phase),
-			PodIP:        pod.Status.PodIP,
-			NodeName:     pod.Spec.NodeName,
-			Ready:        ready,
-			RestartCount: restartCount,
-			OwnerType:    ownerType,
-			OwnerName:    ownerName,
-			CreatedAt:    pod.CreationTimestamp.Time,
+	// Get restart count
+	restartCount := int32(0)
+	for _, cs := range pod.Status.ContainerStatuses {
+		restartCount += cs.RestartCount
+	}
+
+	// Check if pod is ready
+	ready := true
+	for _, cs := range pod.Status.ContainerStatuses {
+		if !cs.Ready {
+			ready = false
+			break
 		}
 	}
 
-	return pods, nil
+	return PodInfo{
+		Name:         pod.Name,
+		Namespace:    pod.Namespace,
+		Status:       string(pod.Status.Phase),
+		Phase:        string(pod.Status.Phase),
+		PodIP:        pod.Status.PodIP,
+		NodeName:     pod.Spec.NodeName,
+		Ready:        ready,
+		RestartCount: restartCount,
+		OwnerType:    ownerType,
+		OwnerName:    ownerName,
+		Labels:       pod.Labels,
+		CreatedAt:    pod.CreationTimestamp.Time,
+	}
 }
 
 // GetDeployments retrieves all deployments from a namespace
@@ -263,28 +280,34 @@ func (c *ClusterClient) GetDeployments(ctx context.Context, namespace string) ([
 	}
 
 	deployments := make([]DeploymentInfo, len(depList.Items))
-	for i, dep := range depList.Items {
-		// Get image from first container
-		image := ""
-		if len(dep.Spec.Template.Spec.Containers) > 0 {
-			image = dep.Spec.Template.Spec.Containers[0].Image
-		}
-
-		deployments[i] = DeploymentInfo{
-			Name:            dep.Name,
-			Namespace:       dep.Namespace,
-			Replicas:        *dep.Spec.Replicas,
-			ReadyReplicas:   dep.Status.ReadyReplicas,
-			UpdatedReplicas: dep.Status.UpdatedReplicas,
-			AvailableReplicas: dep.Status.AvailableReplicas,
-			Image:           image,
-			CreatedAt:       dep.CreationTimestamp.Time,
-		}
+	for i := range depList.Items {
+		deployments[i] = deploymentInfo(&depList.Items[i])
 	}
 
 	return deployments, nil
 }
 
+// deploymentInfo summarizes a deployment
+func deploymentInfo(dep *appsv1.Deployment) DeploymentInfo {
+	// Get image from first container
+	image := ""
+	if len(dep.Spec.Template.Spec.Containers) > 0 {
+		image = dep.Spec.Template.Spec.Containers[0].Image
+	}
+
+	return DeploymentInfo{
+		Name:            dep.Name,
+		Namespace:       dep.Namespace,
+		Replicas:        *dep.Spec.Replicas,
+		ReadyReplicas:   dep.Status.ReadyReplicas,
+		UpdatedReplicas: dep.Status.UpdatedReplicas,
+		AvailableReplicas: dep.Status.AvailableReplicas,
+		Image:           image,
+		Labels:          dep.Labels,
+		CreatedAt:       dep.CreationTimestamp.Time,
+	}
+}
+
 // GetServices retrieves all services from a namespace
 func (c *ClusterClient) GetServices(ctx context.Context, namespace string) ([]ServiceInfo, error) {
 	svcList, err := c.clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
@@ -293,29 +316,35 @@ func (c *ClusterClient) GetServices(ctx context.Context, namespace string) ([]Se
 	}
 
 	services := make([]ServiceInfo, len(svcList.Items))
-	for i, svc := range svcList.Items {
-		// Convert ports
-		ports := make([]ServicePort, len(svc.Spec.Ports))
-		for j, port := range svc.Spec.Ports {
-			ports[j] = ServicePort{
-				Name:     port.Name,
-				Port:     port.Port,
-				Protocol: string(port.Protocol),
-				NodePort: port.NodePort,
-			}
-		}
+	for i := range svcList.Items {
+		services[i] = serviceInfo(&svcList.Items[i])
+	}
 
-		services[i] = ServiceInfo{
-			Name:       svc.Name,
-			Namespace:  svc.Namespace,
-			Type:       string(svc.Spec.Type),
-			ClusterIP:  svc.Spec.ClusterIP,
-			Ports:      ports,
-			CreatedAt:  svc.CreationTimestamp.Time,
+	return services, nil
+}
+
+// serviceInfo summarizes a service
+func serviceInfo(svc *v1.Service) ServiceInfo {
+	// Convert ports
+	ports := make([]ServicePort, len(svc.Spec.Ports))
+	for j, port := range svc.Spec.Ports {
+		ports[j] = ServicePort{
+			Name:     port.Name,
+			Port:     port.Port,
+			Protocol: string(port.Protocol),
+			NodePort: port.NodePort,
 		}
 	}
 
-	return services, nil
+	return ServiceInfo{
+		Name:       svc.Name,
+		Namespace:  svc.Namespace,
+		Type:       string(svc.Spec.Type),
+		ClusterIP:  svc.Spec.ClusterIP,
+		Ports:      ports,
+		Selector:   svc.Spec.Selector,
+		CreatedAt:  svc.CreationTimestamp.Time,
+	}
 }
 
 // GetPodLogs retrieves logs from a pod
@@ -345,6 +374,29 @@ func (c *ClusterClient) GetPodLogs(ctx context.Context, namespace, podName strin
 	return result, nil
 }
 
+// GetPodLogsSince retrieves timestamped logs written by a pod since the given time.
+// Each line is prefixed with its RFC 3339 timestamp.
+func (c *ClusterClient) GetPodLogsSince(ctx context.Context, namespace, podName string, since time.Time, tailLines int64) (string, error) {
+	sinceTime := metav1.NewTime(since)
+	req := c.clientset.CoreV1().Pods(namespace).GetLogs(podName, &v1.PodLogOptions{
+		SinceTime:  &sinceTime,
+		TailLines:  &tailLines,
+		Timestamps: true,
+	})
+
+	logs, err := req.Stream(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get pod logs: %w", err)
+	}
+	defer logs.Close()
+
+	data, err := io.ReadAll(logs)
+	if err != nil {
+		return "", fmt.Errorf("failed to read pod logs: %w", err)
+	}
+	return string(data), nil
+}
+
 // GetPodLogStream returns a stream for pod logs (for websocket streaming)
 func (c *ClusterClient) GetPodLogStream(namespace, podName, containerName string, tailLines int64) io.ReadCloser {
 	options := &v1.PodLogOptions{
@@ -366,6 +418,15 @@ func (c *ClusterClient) DeletePod(ctx context.Context, namespace, podName string
 	return c.clientset.CoreV1().Pods(namespace).Delete(ctx, podName, metav1.DeleteOptions{})
 }
 
+// GetPodLabels retrieves the labels of a pod
+func (c *ClusterClient) GetPodLabels(ctx context.Context, namespace, podName string) (map[string]string, error) {
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod: %w", err)
+	}
+	return pod.Labels, nil
+}
+
 // GetPodDetail retrieves detailed information about a specific pod
 func (c *ClusterClient) GetPodDetail(ctx context.Context, namespace, podName string) (*PodDetailInfo, error) {
 	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
@@ -420,7 +481,10 @@ func (c *ClusterClient) GetPodDetail(ctx context.Context, namespace, podName str
 
 	// Get events
 	events, err := c.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
-		FieldSelector: fmt.Sprintf("involvedObject.name=%s,involvedObject.kind=Pod", podName),
+		FieldSelector: fields.Set{
+			"involvedObject.name": podName,
+			"involvedObject.kind": "Pod",
+		}.AsSelector().String(),
 	})
 	podEvents := make([]EventInfo, 0)
 	if err == nil {
@@ -436,6 +500,19 @@ func (c *ClusterClient) GetPodDetail(ctx context.Context, namespace, podName str
 		}
 	}
 
+	// Current usage is best effort, the detail is still returned without metrics-server
+	var usage *PodUsage
+	if metricsClient, err := c.MetricsClient(); err == nil {
+		if usage, err = metricsClient.GetPodUsage(ctx, namespace, podName); err == nil {
+			for _, container := range pod.Spec.Containers {
+				usage.CPURequestCores += float64(container.Resources.Requests.Cpu().MilliValue()) / 1000
+				usage.CPULimitCores += float64(container.Resources.Limits.Cpu().MilliValue()) / 1000
+				usage.MemoryRequestBytes += container.Resources.Requests.Memory().Value()
+				usage.MemoryLimitBytes += container.Resources.Limits.Memory().Value()
+			}
+		}
+	}
+
 	return &PodDetailInfo{
 		Name:              pod.Name,
 		Namespace:         pod.Namespace,
@@ -458,6 +535,7 @@ func (c *ClusterClient) GetPodDetail(ctx context.Context, namespace, podName str
 		CreatedAt:         pod.CreationTimestamp.Time,
 		StartTime:         getTimePtr(pod.Status.StartTime),
 		QOSClass:          string(pod.Status.QOSClass),
+		Usage:             usage,
 	}, nil
 }
 
@@ -565,6 +643,7 @@ type NodeInfo struct {
 	CPUAllocatable    string `json:"cpuAllocatable"`
 	MemoryAllocatable string `json:"memoryAllocatable"`
 	StorageAllocatable string `json:"storageAllocatable"`
+	Unschedulable     bool   `json:"unschedulable"` // Cordoned
 }
 
 type ClusterInfo struct {
@@ -590,6 +669,7 @@ type PodInfo struct {
 	RestartCount int32     `json:"restartCount"`
 	OwnerType    string    `json:"ownerType,omitempty"`
 	OwnerName    string    `json:"ownerName,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
 	CreatedAt    time.Time `json:"createdAt"`
 }
 
@@ -601,6 +681,7 @@ type DeploymentInfo struct {
 	UpdatedReplicas   int32     `json:"updatedReplicas"`
 	AvailableReplicas int32     `json:"availableReplicas"`
 	Image             string    `json:"image"`
+	Labels            map[string]string `json:"labels,omitempty"`
 	CreatedAt         time.Time `json:"createdAt"`
 }
 
@@ -610,6 +691,7 @@ type ServiceInfo struct {
 	Type      string       `json:"type"`
 	ClusterIP string       `json:"clusterIp"`
 	Ports     []ServicePort `json:"ports"`
+	Selector  map[string]string `json:"selector,omitempty"`
 	CreatedAt time.Time    `json:"createdAt"`
 }
 
@@ -642,6 +724,9 @@ type PodDetailInfo struct {
 	CreatedAt      time.Time         `json:"createdAt"`
 	StartTime      *time.Time        `json:"startTime,omitempty"`
 	QOSClass       string            `json:"qosClass"`
+	// Usage is nil when metrics-server is not installed
+	Usage        *PodUsage        `json:"usage,omitempty"`
+	UsageHistory []PodUsageSample `json:"usageHistory,omitempty"`
 }
 
 type ContainerInfo struct {
@@ -0,0 +1,425 @@
+// Package k8s provides OpenTelemetry collector workload management
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Collector workload annotations
+const (
+	// CollectorConfigHashAnnotation on the pod template rolls the pods when the config changes
+	CollectorConfigHashAnnotation = "myops.io/config-hash"
+	collectorRestartAnnotation    = "myops.io/restarted-at"
+	collectorManagedByLabel       = "app.kubernetes.io/managed-by"
+	collectorManagedBy            = "myops"
+)
+
+// CollectorHealthPort is the port of the health_check extension used for probes
+const CollectorHealthPort = 13133
+
+// CollectorSpec describes an OpenTelemetry collector workload
+type CollectorSpec struct {
+	Name       string
+	Namespace  string
+	DaemonSet  bool // DaemonSet instead of Deployment
+	Image      string
+	Replicas   int32 // Deployment only
+	Config     string
+	ConfigHash string
+	Resources  string // JSON corev1.ResourceRequirements; defaults apply when empty
+}
+
+// CollectorWorkloadStatus represents the observed state of a collector workload
+type CollectorWorkloadStatus struct {
+	Exists        bool
+	Desired       int32
+	Ready         int32
+	Updated       int32
+	ConfigHash    string // Hash of the config the pod template runs
+	PodNames      []string
+	Failed        bool // Rollout stalled or pods crash looping
+	FailureReason string
+}
+
+// ApplyCollector creates or updates the ConfigMap, workload and Service of a collector.
+// Pods only roll when the config hash or pod spec changes, and a Deployment rolls
+// one pod at a time behind readiness probes so a bad config does not take it down.
+func (c *ClusterClient) ApplyCollector(ctx context.Context, spec *CollectorSpec) error {
+	if err := c.ensureNamespace(ctx, spec.Namespace); err != nil {
+		return err
+	}
+
+	var resources corev1.ResourceRequirements
+	if strings.TrimSpace(spec.Resources) != "" {
+		if err := json.Unmarshal([]byte(spec.Resources), &resources); err != nil {
+			return fmt.Errorf("invalid collector resources: %w", err)
+		}
+	}
+
+	labels := collectorLabels(spec.Name)
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      collectorConfigMapName(spec.Name),
+			Namespace: spec.Namespace,
+			Labels:    labels,
+		},
+		Data: map[string]string{"config.yaml": spec.Config},
+	}
+	configMaps := c.clientset.CoreV1().ConfigMaps(spec.Namespace)
+	if existing, err := configMaps.Get(ctx, configMap.Name, metav1.GetOptions{}); err == nil {
+		existing.Data = configMap.Data
+		existing.Labels = labels
+		if _, err := configMaps.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update collector config: %w", err)
+		}
+	} else if apierrors.IsNotFound(err) {
+		if _, err := configMaps.Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create collector config: %w", err)
+		}
+	} else {
+		return fmt.Errorf("failed to get collector config: %w", err)
+	}
+
+	template := collectorPodTemplate(spec, labels, resources)
+	if spec.DaemonSet {
+		if err := c.applyCollectorDaemonSet(ctx, spec, labels, template); err != nil {
+			return err
+		}
+	} else {
+		if err := c.applyCollectorDeployment(ctx, spec, labels, template); err != nil {
+			return err
+		}
+	}
+
+	return c.applyCollectorService(ctx, spec, labels)
+}
+
+func (c *ClusterClient) applyCollectorDeployment(ctx context.Context, spec *CollectorSpec, labels map[string]string, template corev1.PodTemplateSpec) error {
+	replicas := spec.Replicas
+	if replicas < 1 {
+		replicas = 1
+	}
+	maxUnavailable := intstr.FromInt(0)
+	maxSurge := intstr.FromInt(1)
+
+	deployments := c.clientset.AppsV1().Deployments(spec.Namespace)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: spec.Name, Namespace: spec.Namespace, Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RollingUpdateDeploymentStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateDeployment{
+					MaxUnavailable: &maxUnavailable,
+					MaxSurge:       &maxSurge,
+				},
+			},
+			Template: template,
+		},
+	}
+
+	existing, err := deployments.Get(ctx, spec.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := deployments.Create(ctx, deployment, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create collector deployment: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get collector deployment: %w", err)
+	}
+
+	preserveRestartAnnotation(&existing.Spec.Template, &deployment.Spec.Template)
+	existing.Labels = labels
+	existing.Spec.Replicas = deployment.Spec.Replicas
+	existing.Spec.Strategy = deployment.Spec.Strategy
+	existing.Spec.Template = deployment.Spec.Template
+	if _, err := deployments.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update collector deployment: %w", err)
+	}
+	return nil
+}
+
+func (c *ClusterClient) applyCollectorDaemonSet(ctx context.Context, spec *CollectorSpec, labels map[string]string, template corev1.PodTemplateSpec) error {
+	maxUnavailable := intstr.FromInt(1)
+
+	daemonSets := c.clientset.AppsV1().DaemonSets(spec.Namespace)
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: spec.Name, Namespace: spec.Namespace, Labels: labels},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			UpdateStrategy: appsv1.DaemonSetUpdateStrategy{
+				Type:          appsv1.RollingUpdateDaemonSetStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateDaemonSet{MaxUnavailable: &maxUnavailable},
+			},
+			Template: template,
+		},
+	}
+
+	existing, err := daemonSets.Get(ctx, spec.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := daemonSets.Create(ctx, daemonSet, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create collector daemonset: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get collector daemonset: %w", err)
+	}
+
+	preserveRestartAnnotation(&existing.Spec.Template, &daemonSet.Spec.Template)
+	existing.Labels = labels
+	existing.Spec.UpdateStrategy = daemonSet.Spec.UpdateStrategy
+	existing.Spec.Template = daemonSet.Spec.Template
+	if _, err := daemonSets.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update collector daemonset: %w", err)
+	}
+	return nil
+}
+
+func (c *ClusterClient) applyCollectorService(ctx context.Context, spec *CollectorSpec, labels map[string]string) error {
+	services := c.clientset.CoreV1().Services(spec.Namespace)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: spec.Name, Namespace: spec.Namespace, Labels: labels},
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports: []corev1.ServicePort{
+				{Name: "otlp-grpc", Port: 4317, TargetPort: intstr.FromInt(4317)},
+				{Name: "otlp-http", Port: 4318, TargetPort: intstr.FromInt(4318)},
+				{Name: "metrics", Port: 8888, TargetPort: intstr.FromInt(8888)},
+			},
+		},
+	}
+
+	existing, err := services.Get(ctx, spec.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := services.Create(ctx, service, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create collector service: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get collector service: %w", err)
+	}
+
+	existing.Labels = labels
+	existing.Spec.Selector = service.Spec.Selector
+	existing.Spec.Ports = service.Spec.Ports
+	if _, err := services.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update collector service: %w", err)
+	}
+	return nil
+}
+
+// RestartCollector rolls the collector pods, like kubectl rollout restart
+func (c *ClusterClient) RestartCollector(ctx context.Context, namespace, name string, daemonSet bool) error {
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`,
+		collectorRestartAnnotation, time.Now().UTC().Format(time.RFC3339))
+
+	var err error
+	if daemonSet {
+		_, err = c.clientset.AppsV1().DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	} else {
+		_, err = c.clientset.AppsV1().Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restart collector: %w", err)
+	}
+	return nil
+}
+
+// StopCollector removes the collector workload but keeps its config and Service
+func (c *ClusterClient) StopCollector(ctx context.Context, namespace, name string, daemonSet bool) error {
+	var err error
+	if daemonSet {
+		err = c.clientset.AppsV1().DaemonSets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	} else {
+		err = c.clientset.AppsV1().Deployments(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to stop collector: %w", err)
+	}
+	return nil
+}
+
+// DeleteCollector removes the collector workload, Service and ConfigMap
+func (c *ClusterClient) DeleteCollector(ctx context.Context, namespace, name string, daemonSet bool) error {
+	if err := c.StopCollector(ctx, namespace, name, daemonSet); err != nil {
+		return err
+	}
+	if err := c.clientset.CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete collector service: %w", err)
+	}
+	if err := c.clientset.CoreV1().ConfigMaps(namespace).Delete(ctx, collectorConfigMapName(name), metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete collector config: %w", err)
+	}
+	return nil
+}
+
+// GetCollectorStatus reads the rollout state and pods of a collector workload
+func (c *ClusterClient) GetCollectorStatus(ctx context.Context, namespace, name string, daemonSet bool) (*CollectorWorkloadStatus, error) {
+	status := &CollectorWorkloadStatus{PodNames: []string{}}
+
+	if daemonSet {
+		ds, err := c.clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return status, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get collector daemonset: %w", err)
+		}
+		status.Exists = true
+		status.Desired = ds.Status.DesiredNumberScheduled
+		status.Ready = ds.Status.NumberReady
+		status.Updated = ds.Status.UpdatedNumberScheduled
+		status.ConfigHash = ds.Spec.Template.Annotations[CollectorConfigHashAnnotation]
+	} else {
+		deployment, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return status, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get collector deployment: %w", err)
+		}
+		status.Exists = true
+		if deployment.Spec.Replicas != nil {
+			status.Desired = *deployment.Spec.Replicas
+		}
+		status.Ready = deployment.Status.ReadyReplicas
+		status.Updated = deployment.Status.UpdatedReplicas
+		status.ConfigHash = deployment.Spec.Template.Annotations[CollectorConfigHashAnnotation]
+		for _, condition := range deployment.Status.Conditions {
+			if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+				status.Failed = true
+				status.FailureReason = condition.Message
+			}
+		}
+	}
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app.kubernetes.io/instance=" + name + "," + collectorManagedByLabel + "=" + collectorManagedBy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collector pods: %w", err)
+	}
+	for _, pod := range pods.Items {
+		status.PodNames = append(status.PodNames, pod.Name)
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.State.Waiting != nil && cs.State.Waiting.Reason == "CrashLoopBackOff" {
+				status.Failed = true
+				status.FailureReason = fmt.Sprintf("pod %s is crash looping: %s", pod.Name, strings.TrimSpace(cs.State.Waiting.Message))
+			}
+		}
+	}
+
+	return status, nil
+}
+
+// ensureNamespace creates the namespace if it does not exist
+func (c *ClusterClient) ensureNamespace(ctx context.Context, name string) error {
+	_, err := c.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get namespace: %w", err)
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if _, err := c.clientset.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create namespace: %w", err)
+	}
+	return nil
+}
+
+// collectorPodTemplate builds the collector pod template with health probes on the
+// health_check extension and the config hash annotation
+func collectorPodTemplate(spec *CollectorSpec, labels map[string]string, resources corev1.ResourceRequirements) corev1.PodTemplateSpec {
+	probe := &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{Path: "/", Port: intstr.FromInt(CollectorHealthPort)},
+		},
+		PeriodSeconds:    10,
+		FailureThreshold: 3,
+	}
+	liveness := probe.DeepCopy()
+	liveness.InitialDelaySeconds = 15
+
+	if resources.Requests == nil && resources.Limits == nil {
+		resources = corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("100m"),
+				corev1.ResourceMemory: resource.MustParse("128Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("512Mi"),
+			},
+		}
+	}
+
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      labels,
+			Annotations: map[string]string{CollectorConfigHashAnnotation: spec.ConfigHash},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "otel-collector",
+				Image: spec.Image,
+				Args:  []string{"--config=/conf/config.yaml"},
+				Ports: []corev1.ContainerPort{
+					{Name: "otlp-grpc", ContainerPort: 4317},
+					{Name: "otlp-http", ContainerPort: 4318},
+					{Name: "metrics", ContainerPort: 8888},
+					{Name: "health", ContainerPort: CollectorHealthPort},
+				},
+				ReadinessProbe: probe,
+				LivenessProbe:  liveness,
+				Resources:      resources,
+				VolumeMounts: []corev1.VolumeMount{
+					{Name: "config", MountPath: "/conf", ReadOnly: true},
+				},
+			}},
+			Volumes: []corev1.Volume{{
+				Name: "config",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: collectorConfigMapName(spec.Name)},
+					},
+				},
+			}},
+		},
+	}
+}
+
+// preserveRestartAnnotation keeps a previous rollout restart so updates do not roll the pods again
+func preserveRestartAnnotation(existing, updated *corev1.PodTemplateSpec) {
+	if restartedAt, ok := existing.Annotations[collectorRestartAnnotation]; ok {
+		updated.Annotations[collectorRestartAnnotation] = restartedAt
+	}
+}
+
+func collectorLabels(name string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":     "opentelemetry-collector",
+		"app.kubernetes.io/instance": name,
+		collectorManagedByLabel:      collectorManagedBy,
+	}
+}
+
+func collectorConfigMapName(name string) string {
+	return name + "-config"
+}
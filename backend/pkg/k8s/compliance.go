@@ -0,0 +1,323 @@
+// Package k8s provides CIS Kubernetes Benchmark checks evaluated through the API
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Benchmark check outcomes
+const (
+	BenchmarkPass    = "pass"
+	BenchmarkFail    = "fail"
+	BenchmarkSkipped = "skipped" // Not applicable to the cluster
+	BenchmarkError   = "error"   // The objects it inspects could not be read
+)
+
+// benchmarkEvidenceLimit caps the offending objects named in evidence
+const benchmarkEvidenceLimit = 10
+
+// BenchmarkResult is the outcome of one CIS Kubernetes Benchmark check
+type BenchmarkResult struct {
+	ID       string `json:"id"` // Benchmark section, e.g. 1.2.1
+	Status   string `json:"status"`
+	Evidence string `json:"evidence"`
+}
+
+// controlPlaneFlagCheck checks a flag of a control plane component
+type controlPlaneFlagCheck struct {
+	id        string
+	component string // Value of the component label of its static pod
+	flag      string
+	want      string // What the flag should be, for the evidence
+	pass      func(value string, set bool) bool
+}
+
+var controlPlaneFlagChecks = []controlPlaneFlagCheck{
+	{"1.2.1", "kube-apiserver", "anonymous-auth", "false", flagEquals("false")},
+	{"1.2.5", "kube-apiserver", "kubelet-certificate-authority", "set", flagSet},
+	{"1.2.6", "kube-apiserver", "authorization-mode", "without AlwaysAllow", func(value string, set bool) bool {
+		return set && !flagListContains(value, "AlwaysAllow")
+	}},
+	{"1.2.7", "kube-apiserver", "authorization-mode", "to include Node", flagIncludes("Node")},
+	{"1.2.8", "kube-apiserver", "authorization-mode", "to include RBAC", flagIncludes("RBAC")},
+	{"1.2.15", "kube-apiserver", "enable-admission-plugins", "to include NodeRestriction", flagIncludes("NodeRestriction")},
+	{"1.2.16", "kube-apiserver", "profiling", "false", flagEquals("false")},
+	{"1.2.17", "kube-apiserver", "audit-log-path", "set", flagSet},
+	{"1.3.2", "kube-controller-manager", "profiling", "false", flagEquals("false")},
+	{"1.3.3", "kube-controller-manager", "use-service-account-credentials", "true", flagEquals("true")},
+	{"1.4.1", "kube-scheduler", "profiling", "false", flagEquals("false")},
+	{"2.2", "etcd", "client-cert-auth", "true", flagEquals("true")},
+}
+
+func flagEquals(want string) func(string, bool) bool {
+	return func(value string, set bool) bool { return set && value == want }
+}
+
+func flagSet(value string, set bool) bool { return set && value != "" }
+
+func flagIncludes(want string) func(string, bool) bool {
+	return func(value string, set bool) bool { return set && flagListContains(value, want) }
+}
+
+func flagListContains(value, want string) bool {
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// RunBenchmark evaluates the CIS Kubernetes Benchmark checks that can be read from
+// the API: control plane flags from the static pods in kube-system, RBAC, and pod
+// and namespace policies. Control plane checks are skipped when those pods are not
+// visible, as on managed clusters.
+func (c *ClusterClient) RunBenchmark(ctx context.Context) ([]BenchmarkResult, error) {
+	pods, err := c.clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	namespaces, err := c.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	results := controlPlaneChecks(pods.Items)
+	results = append(results, c.rbacChecks(ctx)...)
+	results = append(results, c.serviceAccountCheck(ctx))
+	results = append(results, podChecks(pods.Items)...)
+	results = append(results, namespaceChecks(namespaces.Items)...)
+	results = append(results, c.networkPolicyCheck(ctx, namespaces.Items))
+	return results, nil
+}
+
+// controlPlaneChecks reads the flags of the control plane static pods
+func controlPlaneChecks(pods []v1.Pod) []BenchmarkResult {
+	flags := make(map[string]map[string]string)
+	for i := range pods {
+		pod := &pods[i]
+		component := pod.Labels["component"]
+		if pod.Namespace != "kube-system" || component == "" || flags[component] != nil || len(pod.Spec.Containers) == 0 {
+			continue
+		}
+		container := pod.Spec.Containers[0]
+		parsed := make(map[string]string)
+		for _, arg := range append(append([]string{}, container.Command...), container.Args...) {
+			if !strings.HasPrefix(arg, "--") {
+				continue
+			}
+			name, value, ok := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+			if !ok {
+				value = "true"
+			}
+			parsed[name] = value
+		}
+		flags[component] = parsed
+	}
+
+	results := make([]BenchmarkResult, 0, len(controlPlaneFlagChecks))
+	for _, check := range controlPlaneFlagChecks {
+		componentFlags, ok := flags[check.component]
+		if !ok {
+			results = append(results, BenchmarkResult{
+				ID:       check.id,
+				Status:   BenchmarkSkipped,
+				Evidence: fmt.Sprintf("No %s pod is visible in kube-system", check.component),
+			})
+			continue
+		}
+		value, set := componentFlags[check.flag]
+		result := BenchmarkResult{ID: check.id, Status: BenchmarkPass}
+		if !check.pass(value, set) {
+			result.Status = BenchmarkFail
+		}
+		if set {
+			result.Evidence = fmt.Sprintf("%s --%s=%s (want %s)", check.component, check.flag, value, check.want)
+		} else {
+			result.Evidence = fmt.Sprintf("%s --%s is not set (want %s)", check.component, check.flag, check.want)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// rbacChecks flags cluster-admin bindings and wildcard rules
+func (c *ClusterClient) rbacChecks(ctx context.Context) []BenchmarkResult {
+	var admins []string
+	bindings, err := c.clientset.RbacV1().ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	if err == nil {
+		for _, binding := range bindings.Items {
+			if binding.RoleRef.Name != "cluster-admin" {
+				continue
+			}
+			for _, subject := range binding.Subjects {
+				if subject.Kind == "Group" && subject.Name == "system:masters" {
+					continue
+				}
+				admins = append(admins, fmt.Sprintf("ClusterRoleBinding/%s (%s %s)", binding.Name, subject.Kind, subject.Name))
+			}
+		}
+	}
+	results := []BenchmarkResult{
+		benchmarkListResult("5.1.1", err, admins, "cluster-admin bindings outside system:masters", "cluster-admin is only bound to system:masters"),
+	}
+
+	var wildcards []string
+	clusterRoles, err := c.clientset.RbacV1().ClusterRoles().List(ctx, metav1.ListOptions{})
+	if err == nil {
+		for _, role := range clusterRoles.Items {
+			if !strings.HasPrefix(role.Name, "system:") && role.Name != "cluster-admin" && rulesHaveWildcard(role.Rules) {
+				wildcards = append(wildcards, "ClusterRole/"+role.Name)
+			}
+		}
+		var roles *rbacv1.RoleList
+		if roles, err = c.clientset.RbacV1().Roles("").List(ctx, metav1.ListOptions{}); err == nil {
+			for _, role := range roles.Items {
+				if !strings.HasPrefix(role.Name, "system:") && rulesHaveWildcard(role.Rules) {
+					wildcards = append(wildcards, "Role/"+role.Namespace+"/"+role.Name)
+				}
+			}
+		}
+	}
+	return append(results, benchmarkListResult("5.1.3", err, wildcards, "roles with wildcard verbs, resources or API groups", "No role uses wildcards"))
+}
+
+// serviceAccountCheck flags default service accounts that mount their token
+func (c *ClusterClient) serviceAccountCheck(ctx context.Context) BenchmarkResult {
+	var mounted []string
+	accounts, err := c.clientset.CoreV1().ServiceAccounts("").List(ctx, metav1.ListOptions{FieldSelector: "metadata.name=default"})
+	if err == nil {
+		for _, account := range accounts.Items {
+			if account.AutomountServiceAccountToken == nil || *account.AutomountServiceAccountToken {
+				mounted = append(mounted, account.Namespace)
+			}
+		}
+	}
+	return benchmarkListResult("5.1.5", err, mounted, "namespaces whose default service account automounts its token", "No default service account automounts its token")
+}
+
+// podChecks flags pods outside the kube- namespaces that share host namespaces,
+// run privileged containers or read secrets from environment variables, and pods
+// in the default namespace
+func podChecks(pods []v1.Pod) []BenchmarkResult {
+	var privileged, hostPID, hostIPC, hostNetwork, secretEnv, inDefault []string
+	for i := range pods {
+		pod := &pods[i]
+		name := pod.Namespace + "/" + pod.Name
+		if pod.Namespace == "default" {
+			inDefault = append(inDefault, pod.Name)
+		}
+		if strings.HasPrefix(pod.Namespace, "kube-") {
+			continue
+		}
+		if pod.Spec.HostPID {
+			hostPID = append(hostPID, name)
+		}
+		if pod.Spec.HostIPC {
+			hostIPC = append(hostIPC, name)
+		}
+		if pod.Spec.HostNetwork {
+			hostNetwork = append(hostNetwork, name)
+		}
+		containers := append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+		isPrivileged, usesSecretEnv := false, false
+		for _, container := range containers {
+			if sc := container.SecurityContext; sc != nil && sc.Privileged != nil && *sc.Privileged {
+				isPrivileged = true
+			}
+			for _, env := range container.Env {
+				if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+					usesSecretEnv = true
+				}
+			}
+			for _, from := range container.EnvFrom {
+				if from.SecretRef != nil {
+					usesSecretEnv = true
+				}
+			}
+		}
+		if isPrivileged {
+			privileged = append(privileged, name)
+		}
+		if usesSecretEnv {
+			secretEnv = append(secretEnv, name)
+		}
+	}
+
+	return []BenchmarkResult{
+		benchmarkListResult("5.2.2", nil, privileged, "pods with privileged containers", "No pod runs privileged containers"),
+		benchmarkListResult("5.2.3", nil, hostPID, "pods sharing the host PID namespace", "No pod shares the host PID namespace"),
+		benchmarkListResult("5.2.4", nil, hostIPC, "pods sharing the host IPC namespace", "No pod shares the host IPC namespace"),
+		benchmarkListResult("5.2.5", nil, hostNetwork, "pods sharing the host network", "No pod shares the host network"),
+		benchmarkListResult("5.4.1", nil, secretEnv, "pods reading secrets from environment variables", "No pod reads secrets from environment variables"),
+		benchmarkListResult("5.7.4", nil, inDefault, "pods in the default namespace", "The default namespace has no pods"),
+	}
+}
+
+// namespaceChecks flags namespaces without an enforced Pod Security Standard
+func namespaceChecks(namespaces []v1.Namespace) []BenchmarkResult {
+	var unenforced []string
+	for _, namespace := range namespaces {
+		if strings.HasPrefix(namespace.Name, "kube-") {
+			continue
+		}
+		if namespace.Labels["pod-security.kubernetes.io/enforce"] == "" {
+			unenforced = append(unenforced, namespace.Name)
+		}
+	}
+	return []BenchmarkResult{
+		benchmarkListResult("5.2.1", nil, unenforced, "namespaces without an enforced Pod Security Standard", "Every namespace enforces a Pod Security Standard"),
+	}
+}
+
+// networkPolicyCheck flags namespaces without NetworkPolicies
+func (c *ClusterClient) networkPolicyCheck(ctx context.Context, namespaces []v1.Namespace) BenchmarkResult {
+	var uncovered []string
+	policies, err := c.clientset.NetworkingV1().NetworkPolicies("").List(ctx, metav1.ListOptions{})
+	if err == nil {
+		covered := make(map[string]bool)
+		for _, policy := range policies.Items {
+			covered[policy.Namespace] = true
+		}
+		for _, namespace := range namespaces {
+			if !strings.HasPrefix(namespace.Name, "kube-") && !covered[namespace.Name] {
+				uncovered = append(uncovered, namespace.Name)
+			}
+		}
+	}
+	return benchmarkListResult("5.3.2", err, uncovered, "namespaces without NetworkPolicies", "Every namespace has a NetworkPolicy")
+}
+
+// rulesHaveWildcard reports whether a rule grants every verb, resource or API group
+func rulesHaveWildcard(rules []rbacv1.PolicyRule) bool {
+	for _, rule := range rules {
+		if containsValue(rule.Verbs, "*") || containsValue(rule.Resources, "*") || containsValue(rule.APIGroups, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// benchmarkListResult passes when offenders is empty and fails naming them
+// otherwise, or reports err when the objects could not be read
+func benchmarkListResult(id string, err error, offenders []string, what, clean string) BenchmarkResult {
+	if err != nil {
+		return BenchmarkResult{ID: id, Status: BenchmarkError, Evidence: err.Error()}
+	}
+	if len(offenders) == 0 {
+		return BenchmarkResult{ID: id, Status: BenchmarkPass, Evidence: clean}
+	}
+	sort.Strings(offenders)
+	evidence := fmt.Sprintf("%d %s: %s", len(offenders), what, strings.Join(offenders[:min(len(offenders), benchmarkEvidenceLimit)], ", "))
+	if len(offenders) > benchmarkEvidenceLimit {
+		evidence += fmt.Sprintf(" and %d more", len(offenders)-benchmarkEvidenceLimit)
+	}
+	return BenchmarkResult{ID: id, Status: BenchmarkFail, Evidence: evidence}
+}
@@ -0,0 +1,200 @@
+// Package k8s provides inspection of the credentials in kubeconfigs
+package k8s
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Credential types reported by InspectCredentials
+const (
+	CredentialClientCertificate = "client-certificate"
+	CredentialToken             = "token"
+	CredentialExec              = "exec"
+	CredentialAuthProvider      = "auth-provider"
+	CredentialBasicAuth         = "basic-auth"
+	CredentialNone              = "none"
+)
+
+// CredentialInfo describes the credentials a kubeconfig authenticates with
+type CredentialInfo struct {
+	Context     string     `json:"context"`
+	Server      string     `json:"server"`
+	Type        string     `json:"type"`
+	Subject     string     `json:"subject,omitempty"`
+	Issuer      string     `json:"issuer,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`   // nil when the credentials do not say
+	CAExpiresAt *time.Time `json:"caExpiresAt,omitempty"` // Earliest expiry of the embedded cluster CA
+}
+
+// InspectCredentials reads the credentials of the kubeconfig's current context and
+// when they expire. Only embedded certificates and tokens can be inspected; exec
+// plugins and files referenced by path are reported without an expiry.
+func InspectCredentials(kubeconfig []byte) (*CredentialInfo, error) {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %w", err)
+	}
+
+	contextName := config.CurrentContext
+	if contextName == "" && len(config.Contexts) == 1 {
+		for name := range config.Contexts {
+			contextName = name
+		}
+	}
+	kubeContext, ok := config.Contexts[contextName]
+	if !ok {
+		return nil, fmt.Errorf("kubeconfig has no current context")
+	}
+	info := &CredentialInfo{Context: contextName, Type: CredentialNone}
+
+	if cluster, ok := config.Clusters[kubeContext.Cluster]; ok {
+		info.Server = cluster.Server
+		if len(cluster.CertificateAuthorityData) > 0 {
+			certs, err := parseCertificates(cluster.CertificateAuthorityData)
+			if err != nil {
+				return nil, fmt.Errorf("invalid certificate-authority-data: %w", err)
+			}
+			info.CAExpiresAt = earliestExpiry(certs)
+		}
+	}
+
+	authInfo, ok := config.AuthInfos[kubeContext.AuthInfo]
+	if !ok {
+		return info, nil
+	}
+	if err := inspectAuthInfo(info, authInfo); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// inspectAuthInfo fills in the credential type, identity and expiry of a user entry
+func inspectAuthInfo(info *CredentialInfo, authInfo *clientcmdapi.AuthInfo) error {
+	switch {
+	case len(authInfo.ClientCertificateData) > 0:
+		info.Type = CredentialClientCertificate
+		certs, err := parseCertificates(authInfo.ClientCertificateData)
+		if err != nil {
+			return fmt.Errorf("invalid client-certificate-data: %w", err)
+		}
+		// The first certificate is the client's; any others are intermediates
+		info.Subject = certs[0].Subject.String()
+		info.Issuer = certs[0].Issuer.String()
+		info.ExpiresAt = earliestExpiry(certs)
+	case authInfo.ClientCertificate != "":
+		info.Type = CredentialClientCertificate
+	case authInfo.Token != "":
+		info.Type = CredentialToken
+		if claims, ok := jwtClaims(authInfo.Token); ok {
+			info.Subject, info.Issuer, info.ExpiresAt = claims.Subject, claims.Issuer, claims.expiry()
+		}
+	case authInfo.TokenFile != "":
+		info.Type = CredentialToken
+	case authInfo.Exec != nil:
+		info.Type = CredentialExec
+	case authInfo.AuthProvider != nil:
+		info.Type = CredentialAuthProvider
+		providerConfig := authInfo.AuthProvider.Config
+		if expiry, err := time.Parse(time.RFC3339, providerConfig["expiry"]); err == nil {
+			info.ExpiresAt = &expiry
+		} else if providerConfig["refresh-token"] == "" {
+			// OIDC ID tokens without a refresh token cannot be renewed
+			if claims, ok := jwtClaims(providerConfig["id-token"]); ok {
+				info.Subject, info.Issuer, info.ExpiresAt = claims.Subject, claims.Issuer, claims.expiry()
+			}
+		}
+	case authInfo.Username != "":
+		info.Type = CredentialBasicAuth
+		info.Subject = authInfo.Username
+	}
+	return nil
+}
+
+// parseCertificates decodes the PEM encoded certificates in data
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificate")
+	}
+	return certs, nil
+}
+
+// earliestExpiry returns the first NotAfter of certs
+func earliestExpiry(certs []*x509.Certificate) *time.Time {
+	expiry := certs[0].NotAfter
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+	return &expiry
+}
+
+// tokenClaims are the registered JWT claims read from bearer tokens
+type tokenClaims struct {
+	Subject string `json:"sub"`
+	Issuer  string `json:"iss"`
+	Expiry  int64  `json:"exp"`
+}
+
+func (c *tokenClaims) expiry() *time.Time {
+	if c.Expiry == 0 {
+		return nil
+	}
+	expiry := time.Unix(c.Expiry, 0)
+	return &expiry
+}
+
+// jwtClaims reads the claims of a JWT without verifying it. Tokens that are not
+// JWTs, such as static tokens, report false.
+func jwtClaims(token string) (*tokenClaims, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, false
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, false
+	}
+	return &claims, true
+}
+
+// ClusterUID returns the UID of the kube-system namespace, which identifies a
+// cluster whichever credentials or endpoint it is reached with
+func (c *ClusterClient) ClusterUID(ctx context.Context) (string, error) {
+	namespace, err := c.clientset.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get kube-system namespace: %w", err)
+	}
+	return string(namespace.UID), nil
+}
@@ -0,0 +1,344 @@
+// Package k8s provides detection of deprecated and removed Kubernetes APIs
+package k8s
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/metadata"
+	"sigs.k8s.io/yaml"
+)
+
+// Where an APIVersionUse was found
+const (
+	APIUseLive = "live" // The field managers or last applied configuration of a live object
+	APIUseHelm = "helm" // The manifest of a deployed Helm release
+)
+
+// lastAppliedAnnotation holds the manifest kubectl apply last applied
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// DeprecatedAPI is an API version of a kind that is deprecated and removed in
+// later Kubernetes releases
+type DeprecatedAPI struct {
+	APIVersion   string `json:"apiVersion"`
+	Kind         string `json:"kind"`
+	DeprecatedIn string `json:"deprecatedIn"`          // Minor release, e.g. 1.19
+	RemovedIn    string `json:"removedIn"`             // First minor release that no longer serves it
+	Replacement  string `json:"replacement,omitempty"` // apiVersion to migrate to; empty when the kind is gone
+	Notes        string `json:"notes,omitempty"`
+}
+
+// APIVersionUse is an object written or rendered with a deprecated API version
+type APIVersionUse struct {
+	DeprecatedAPI
+	Source    string `json:"source"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Release   string `json:"release,omitempty"` // Helm release, namespace/name
+	Manager   string `json:"manager,omitempty"` // Field manager that wrote the version, for live objects
+}
+
+// deprecations lists kinds that share an API version's deprecation
+func deprecations(apiVersion, deprecatedIn, removedIn, replacement string, kinds ...string) []DeprecatedAPI {
+	apis := make([]DeprecatedAPI, 0, len(kinds))
+	for _, kind := range kinds {
+		apis = append(apis, DeprecatedAPI{APIVersion: apiVersion, Kind: kind, DeprecatedIn: deprecatedIn, RemovedIn: removedIn, Replacement: replacement})
+	}
+	return apis
+}
+
+// DeprecatedAPIs is the deprecation database, after the Kubernetes deprecated
+// API migration guide
+var DeprecatedAPIs = concatAPIs(
+	// Removed in 1.16
+	deprecations("extensions/v1beta1", "1.9", "1.16", "apps/v1", "Deployment", "DaemonSet", "ReplicaSet"),
+	deprecations("apps/v1beta1", "1.9", "1.16", "apps/v1", "Deployment", "StatefulSet"),
+	deprecations("apps/v1beta2", "1.9", "1.16", "apps/v1", "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet"),
+	deprecations("extensions/v1beta1", "1.9", "1.16", "networking.k8s.io/v1", "NetworkPolicy"),
+	deprecations("extensions/v1beta1", "1.10", "1.16", "policy/v1beta1", "PodSecurityPolicy"),
+
+	// Removed in 1.22
+	deprecations("extensions/v1beta1", "1.14", "1.22", "networking.k8s.io/v1", "Ingress"),
+	deprecations("networking.k8s.io/v1beta1", "1.19", "1.22", "networking.k8s.io/v1", "Ingress", "IngressClass"),
+	deprecations("admissionregistration.k8s.io/v1beta1", "1.16", "1.22", "admissionregistration.k8s.io/v1",
+		"MutatingWebhookConfiguration", "ValidatingWebhookConfiguration"),
+	deprecations("apiextensions.k8s.io/v1beta1", "1.16", "1.22", "apiextensions.k8s.io/v1", "CustomResourceDefinition"),
+	deprecations("apiregistration.k8s.io/v1beta1", "1.19", "1.22", "apiregistration.k8s.io/v1", "APIService"),
+	deprecations("authentication.k8s.io/v1beta1", "1.19", "1.22", "authentication.k8s.io/v1", "TokenReview"),
+	deprecations("authorization.k8s.io/v1beta1", "1.19", "1.22", "authorization.k8s.io/v1",
+		"SubjectAccessReview", "LocalSubjectAccessReview", "SelfSubjectAccessReview"),
+	deprecations("certificates.k8s.io/v1beta1", "1.19", "1.22", "certificates.k8s.io/v1", "CertificateSigningRequest"),
+	deprecations("coordination.k8s.io/v1beta1", "1.19", "1.22", "coordination.k8s.io/v1", "Lease"),
+	deprecations("rbac.authorization.k8s.io/v1beta1", "1.17", "1.22", "rbac.authorization.k8s.io/v1",
+		"ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding"),
+	deprecations("scheduling.k8s.io/v1beta1", "1.14", "1.22", "scheduling.k8s.io/v1", "PriorityClass"),
+	deprecations("storage.k8s.io/v1beta1", "1.19", "1.22", "storage.k8s.io/v1", "CSIDriver", "CSINode", "StorageClass", "VolumeAttachment"),
+
+	// Removed in 1.25
+	deprecations("batch/v1beta1", "1.21", "1.25", "batch/v1", "CronJob"),
+	deprecations("discovery.k8s.io/v1beta1", "1.21", "1.25", "discovery.k8s.io/v1", "EndpointSlice"),
+	deprecations("events.k8s.io/v1beta1", "1.19", "1.25", "events.k8s.io/v1", "Event"),
+	deprecations("autoscaling/v2beta1", "1.22", "1.25", "autoscaling/v2", "HorizontalPodAutoscaler"),
+	deprecations("policy/v1beta1", "1.21", "1.25", "policy/v1", "PodDisruptionBudget"),
+	[]DeprecatedAPI{{
+		APIVersion: "policy/v1beta1", Kind: "PodSecurityPolicy", DeprecatedIn: "1.21", RemovedIn: "1.25",
+		Notes: "PodSecurityPolicy is removed without a replacement API; migrate to Pod Security Admission",
+	}},
+	deprecations("node.k8s.io/v1beta1", "1.20", "1.25", "node.k8s.io/v1", "RuntimeClass"),
+
+	// Removed in 1.26 and later
+	deprecations("flowcontrol.apiserver.k8s.io/v1beta1", "1.23", "1.26", "flowcontrol.apiserver.k8s.io/v1", "FlowSchema", "PriorityLevelConfiguration"),
+	deprecations("autoscaling/v2beta2", "1.23", "1.26", "autoscaling/v2", "HorizontalPodAutoscaler"),
+	deprecations("storage.k8s.io/v1beta1", "1.24", "1.27", "storage.k8s.io/v1", "CSIStorageCapacity"),
+	deprecations("flowcontrol.apiserver.k8s.io/v1beta2", "1.26", "1.29", "flowcontrol.apiserver.k8s.io/v1", "FlowSchema", "PriorityLevelConfiguration"),
+	deprecations("flowcontrol.apiserver.k8s.io/v1beta3", "1.29", "1.32", "flowcontrol.apiserver.k8s.io/v1", "FlowSchema", "PriorityLevelConfiguration"),
+)
+
+func concatAPIs(lists ...[]DeprecatedAPI) []DeprecatedAPI {
+	var apis []DeprecatedAPI
+	for _, list := range lists {
+		apis = append(apis, list...)
+	}
+	return apis
+}
+
+// deprecatedAPIIndex finds DeprecatedAPIs by apiVersion and kind
+var deprecatedAPIIndex = func() map[string]*DeprecatedAPI {
+	index := make(map[string]*DeprecatedAPI, len(DeprecatedAPIs))
+	for i := range DeprecatedAPIs {
+		index[DeprecatedAPIs[i].APIVersion+"/"+DeprecatedAPIs[i].Kind] = &DeprecatedAPIs[i]
+	}
+	return index
+}()
+
+// LookupDeprecatedAPI returns the deprecation of an apiVersion of a kind, if it is deprecated
+func LookupDeprecatedAPI(apiVersion, kind string) (*DeprecatedAPI, bool) {
+	api, ok := deprecatedAPIIndex[apiVersion+"/"+kind]
+	return api, ok
+}
+
+// kubernetesVersionPattern matches the major and minor release of versions such
+// as v1.27.3, 1.27 or v1.27.3-gke.100
+var kubernetesVersionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+// ParseKubernetesVersion returns the major and minor release of a version
+func ParseKubernetesVersion(version string) (int, int, error) {
+	match := kubernetesVersionPattern.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return 0, 0, fmt.Errorf("invalid Kubernetes version %q", version)
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	return major, minor, nil
+}
+
+// ServerVersion returns the Kubernetes version the cluster's API server runs
+func (c *ClusterClient) ServerVersion() (string, error) {
+	version, err := c.clientset.Discovery().ServerVersion()
+	if err != nil {
+		return "", fmt.Errorf("failed to get server version: %w", err)
+	}
+	return version.GitVersion, nil
+}
+
+// FindDeprecatedAPIUses finds the live objects and deployed Helm release
+// manifests that use a deprecated API version. The API server converts objects
+// to whatever version they are read with, so live objects are judged by the
+// versions their field managers and last kubectl apply wrote them with.
+func (c *ClusterClient) FindDeprecatedAPIUses(ctx context.Context) ([]APIVersionUse, error) {
+	uses, err := c.deprecatedLiveUses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	releases, err := c.deprecatedHelmUses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(uses, releases...), nil
+}
+
+// deprecatedLiveUses lists the objects of every kind with a deprecated API
+// version, in the version the cluster prefers for it
+func (c *ClusterClient) deprecatedLiveUses(ctx context.Context) ([]APIVersionUse, error) {
+	groups := make(map[string]map[string]bool) // Groups a kind has deprecated or replacement versions in, by kind
+	for _, api := range DeprecatedAPIs {
+		if groups[api.Kind] == nil {
+			groups[api.Kind] = make(map[string]bool)
+		}
+		for _, apiVersion := range []string{api.APIVersion, api.Replacement} {
+			if gv, err := schema.ParseGroupVersion(apiVersion); err == nil && apiVersion != "" {
+				groups[api.Kind][gv.Group] = true
+			}
+		}
+	}
+
+	lists, err := c.clientset.Discovery().ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, fmt.Errorf("failed to discover API resources: %w", err)
+	}
+	client, err := metadata.NewForConfig(c.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metadata client: %w", err)
+	}
+
+	var uses []APIVersionUse
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, resource := range list.APIResources {
+			if strings.Contains(resource.Name, "/") || !groups[resource.Kind][gv.Group] || !containsValue(resource.Verbs, "list") {
+				continue
+			}
+			opts := metav1.ListOptions{Limit: 500}
+			for {
+				objects, err := client.Resource(gv.WithResource(resource.Name)).List(ctx, opts)
+				if err != nil {
+					return nil, fmt.Errorf("failed to list %s: %w", groupResource(gv.Group, resource.Name), err)
+				}
+				for i := range objects.Items {
+					uses = append(uses, objectAPIVersionUses(&objects.Items[i], resource.Kind)...)
+				}
+				if objects.Continue == "" {
+					break
+				}
+				opts.Continue = objects.Continue
+			}
+		}
+	}
+	return uses, nil
+}
+
+// objectAPIVersionUses returns the deprecated versions an object was written with,
+// once per version
+func objectAPIVersionUses(object *metav1.PartialObjectMetadata, kind string) []APIVersionUse {
+	managers := make(map[string]string) // Manager by apiVersion
+	var versions []string
+	record := func(apiVersion, manager string) {
+		if _, seen := managers[apiVersion]; !seen {
+			versions = append(versions, apiVersion)
+		}
+		if managers[apiVersion] == "" {
+			managers[apiVersion] = manager
+		}
+	}
+	for _, entry := range object.ManagedFields {
+		record(entry.APIVersion, entry.Manager)
+	}
+	if applied := object.Annotations[lastAppliedAnnotation]; applied != "" {
+		var manifest struct {
+			APIVersion string `json:"apiVersion"`
+		}
+		if json.Unmarshal([]byte(applied), &manifest) == nil && manifest.APIVersion != "" {
+			record(manifest.APIVersion, "kubectl")
+		}
+	}
+
+	var uses []APIVersionUse
+	for _, apiVersion := range versions {
+		if api, ok := LookupDeprecatedAPI(apiVersion, kind); ok {
+			uses = append(uses, APIVersionUse{
+				DeprecatedAPI: *api,
+				Source:        APIUseLive,
+				Name:          object.Name,
+				Namespace:     object.Namespace,
+				Manager:       managers[apiVersion],
+			})
+		}
+	}
+	return uses
+}
+
+// helmRelease is the part of a Helm 3 release record the platform reads
+type helmRelease struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   int32  `json:"version"`
+	Manifest  string `json:"manifest"`
+}
+
+// manifestSeparator splits a multi-document manifest
+var manifestSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// deprecatedHelmUses reads the manifests of deployed Helm 3 releases, which
+// Helm keeps in secrets, for objects with a deprecated API version
+func (c *ClusterClient) deprecatedHelmUses(ctx context.Context) ([]APIVersionUse, error) {
+	secrets, err := c.clientset.CoreV1().Secrets("").List(ctx, metav1.ListOptions{LabelSelector: "owner=helm,status=deployed"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Helm releases: %w", err)
+	}
+
+	var uses []APIVersionUse
+	for _, secret := range secrets.Items {
+		release, err := decodeHelmRelease(secret.Data["release"])
+		if err != nil {
+			continue // Not a Helm 3 release record
+		}
+		for _, doc := range manifestSeparator.Split(release.Manifest, -1) {
+			var object struct {
+				APIVersion string `json:"apiVersion"`
+				Kind       string `json:"kind"`
+				Metadata   struct {
+					Name      string `json:"name"`
+					Namespace string `json:"namespace"`
+				} `json:"metadata"`
+			}
+			if yaml.Unmarshal([]byte(doc), &object) != nil || object.APIVersion == "" {
+				continue
+			}
+			api, ok := LookupDeprecatedAPI(object.APIVersion, object.Kind)
+			if !ok {
+				continue
+			}
+			namespace := object.Metadata.Namespace
+			if namespace == "" {
+				namespace = release.Namespace
+			}
+			uses = append(uses, APIVersionUse{
+				DeprecatedAPI: *api,
+				Source:        APIUseHelm,
+				Name:          object.Metadata.Name,
+				Namespace:     namespace,
+				Release:       release.Namespace + "/" + release.Name,
+			})
+		}
+	}
+	return uses, nil
+}
+
+// decodeHelmRelease decodes a Helm 3 release record: base64 encoded JSON,
+// usually gzipped
+func decodeHelmRelease(data []byte) (*helmRelease, error) {
+	decoded, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(decoded, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(decoded))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		if decoded, err = io.ReadAll(reader); err != nil {
+			return nil, err
+		}
+	}
+	var release helmRelease
+	if err := json.Unmarshal(decoded, &release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
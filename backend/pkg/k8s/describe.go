@@ -0,0 +1,139 @@
+// Package k8s provides detailed descriptions of Kubernetes workloads
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// DeploymentDescription is a read-only summary of a deployment, similar to kubectl describe
+type DeploymentDescription struct {
+	Name              string                 `json:"name"`
+	Namespace         string                 `json:"namespace"`
+	Labels            map[string]string      `json:"labels,omitempty"`
+	Selector          string                 `json:"selector"`
+	Strategy          string                 `json:"strategy"`
+	Replicas          int32                  `json:"replicas"`
+	ReadyReplicas     int32                  `json:"readyReplicas"`
+	UpdatedReplicas   int32                  `json:"updatedReplicas"`
+	AvailableReplicas int32                  `json:"availableReplicas"`
+	Generation        int64                  `json:"generation"`
+	ObservedGen       int64                  `json:"observedGeneration"`
+	Containers        []ContainerDescription `json:"containers"`
+	Conditions        []DeploymentCondition  `json:"conditions,omitempty"`
+	Events            []WarningEvent         `json:"events,omitempty"`
+	CreatedAt         time.Time              `json:"createdAt"`
+}
+
+// ContainerDescription summarizes a container in a pod template
+type ContainerDescription struct {
+	Name           string            `json:"name"`
+	Image          string            `json:"image"`
+	Requests       map[string]string `json:"requests,omitempty"`
+	Limits         map[string]string `json:"limits,omitempty"`
+	ReadinessProbe bool              `json:"readinessProbe"`
+	LivenessProbe  bool              `json:"livenessProbe"`
+}
+
+// DeploymentCondition is one status condition of a deployment
+type DeploymentCondition struct {
+	Type    string    `json:"type"`
+	Status  string    `json:"status"`
+	Reason  string    `json:"reason,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// DescribeDeployment returns a deployment's spec, status and recent events
+func (c *ClusterClient) DescribeDeployment(ctx context.Context, namespace, name string) (*DeploymentDescription, error) {
+	dep, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	desc := &DeploymentDescription{
+		Name:              dep.Name,
+		Namespace:         dep.Namespace,
+		Labels:            dep.Labels,
+		Strategy:          string(dep.Spec.Strategy.Type),
+		ReadyReplicas:     dep.Status.ReadyReplicas,
+		UpdatedReplicas:   dep.Status.UpdatedReplicas,
+		AvailableReplicas: dep.Status.AvailableReplicas,
+		Generation:        dep.Generation,
+		ObservedGen:       dep.Status.ObservedGeneration,
+		CreatedAt:         dep.CreationTimestamp.Time,
+	}
+	if dep.Spec.Replicas != nil {
+		desc.Replicas = *dep.Spec.Replicas
+	}
+	if dep.Spec.Selector != nil {
+		if selector, err := metav1.LabelSelectorAsSelector(dep.Spec.Selector); err == nil {
+			desc.Selector = selector.String()
+		}
+	}
+
+	for _, container := range dep.Spec.Template.Spec.Containers {
+		cd := ContainerDescription{
+			Name:           container.Name,
+			Image:          container.Image,
+			ReadinessProbe: container.ReadinessProbe != nil,
+			LivenessProbe:  container.LivenessProbe != nil,
+		}
+		for resource, quantity := range container.Resources.Requests {
+			if cd.Requests == nil {
+				cd.Requests = map[string]string{}
+			}
+			cd.Requests[string(resource)] = quantity.String()
+		}
+		for resource, quantity := range container.Resources.Limits {
+			if cd.Limits == nil {
+				cd.Limits = map[string]string{}
+			}
+			cd.Limits[string(resource)] = quantity.String()
+		}
+		desc.Containers = append(desc.Containers, cd)
+	}
+
+	for _, cond := range dep.Status.Conditions {
+		desc.Conditions = append(desc.Conditions, DeploymentCondition{
+			Type:    string(cond.Type),
+			Status:  string(cond.Status),
+			Reason:  cond.Reason,
+			Message: cond.Message,
+			Updated: cond.LastUpdateTime.Time,
+		})
+	}
+
+	// Events for the deployment itself; pod-level events are found through the pods
+	events, err := c.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.kind": "Deployment",
+			"involvedObject.name": name,
+		}.AsSelector().String(),
+	})
+	if err == nil {
+		for _, e := range events.Items {
+			lastSeen := e.LastTimestamp.Time
+			if lastSeen.IsZero() {
+				lastSeen = e.EventTime.Time
+			}
+			desc.Events = append(desc.Events, WarningEvent{
+				Namespace: e.InvolvedObject.Namespace,
+				Kind:      e.InvolvedObject.Kind,
+				Name:      e.InvolvedObject.Name,
+				Reason:    e.Reason,
+				Message:   e.Message,
+				Count:     e.Count,
+				LastSeen:  lastSeen,
+			})
+		}
+		sort.Slice(desc.Events, func(i, j int) bool { return desc.Events[i].LastSeen.After(desc.Events[j].LastSeen) })
+	}
+
+	return desc, nil
+}
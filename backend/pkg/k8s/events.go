@@ -0,0 +1,66 @@
+// Package k8s provides Kubernetes event queries
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WarningEvent summarizes a Warning event and the object it involves
+type WarningEvent struct {
+	Namespace string    `json:"namespace"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Count     int32     `json:"count"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// GetWarningEvents lists Warning events in all namespaces last seen after since,
+// newest first and capped at limit
+func (c *ClusterClient) GetWarningEvents(ctx context.Context, since time.Time, limit int) ([]WarningEvent, error) {
+	list, err := c.clientset.CoreV1().Events("").List(ctx, metav1.ListOptions{
+		FieldSelector: "type=Warning",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	events := make([]WarningEvent, 0, len(list.Items))
+	for _, e := range list.Items {
+		lastSeen := e.LastTimestamp.Time
+		if lastSeen.IsZero() {
+			lastSeen = e.EventTime.Time
+		}
+		if lastSeen.IsZero() {
+			lastSeen = e.CreationTimestamp.Time
+		}
+		if lastSeen.Before(since) {
+			continue
+		}
+		count := e.Count
+		if count == 0 && e.Series != nil {
+			count = e.Series.Count
+		}
+		events = append(events, WarningEvent{
+			Namespace: e.InvolvedObject.Namespace,
+			Kind:      e.InvolvedObject.Kind,
+			Name:      e.InvolvedObject.Name,
+			Reason:    e.Reason,
+			Message:   e.Message,
+			Count:     count,
+			LastSeen:  lastSeen,
+		})
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].LastSeen.After(events[j].LastSeen) })
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
@@ -0,0 +1,45 @@
+// Package k8s provides the manifests of deployed Helm releases
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HelmReleaseManifest is the manifest Helm deployed for a release
+type HelmReleaseManifest struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Revision  int32  `json:"revision"`
+	Manifest  string `json:"manifest"`
+}
+
+// GetHelmReleaseManifest reads the deployed revision of a Helm 3 release from
+// the secret Helm keeps it in. It returns nil when the release is not deployed.
+func (c *ClusterClient) GetHelmReleaseManifest(ctx context.Context, namespace, name string) (*HelmReleaseManifest, error) {
+	secrets, err := c.clientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("owner=helm,status=deployed,name=%s", name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Helm releases: %w", err)
+	}
+
+	var deployed *HelmReleaseManifest
+	for _, secret := range secrets.Items {
+		release, err := decodeHelmRelease(secret.Data["release"])
+		if err != nil || release.Name != name {
+			continue
+		}
+		if deployed == nil || release.Version > deployed.Revision {
+			deployed = &HelmReleaseManifest{
+				Name:      release.Name,
+				Namespace: namespace,
+				Revision:  release.Version,
+				Manifest:  release.Manifest,
+			}
+		}
+	}
+	return deployed, nil
+}
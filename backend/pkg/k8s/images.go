@@ -0,0 +1,124 @@
+// Package k8s provides container image listing for workloads
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WorkloadImage is the image one container of a workload runs. Pods owned by a
+// ReplicaSet are attributed to its Deployment; Digests are what the pods resolved
+// the image to.
+type WorkloadImage struct {
+	Namespace string   `json:"namespace"`
+	Kind      string   `json:"kind"`
+	Name      string   `json:"name"`
+	Container string   `json:"container"`
+	Init      bool     `json:"init,omitempty"`
+	Image     string   `json:"image"`
+	Digests   []string `json:"digests,omitempty"`
+}
+
+// ListWorkloadImages returns the images of the containers of Deployments and of
+// pods, in namespace or in all namespaces when it is empty
+func (c *ClusterClient) ListWorkloadImages(ctx context.Context, namespace string) ([]WorkloadImage, error) {
+	deployments, err := c.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	replicaSets, err := c.clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replica sets: %w", err)
+	}
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	images := make(map[string]*WorkloadImage)
+	var order []string
+	add := func(ns, kind, name string, container v1.Container, init bool) *WorkloadImage {
+		key := ns + "/" + kind + "/" + name + "/" + container.Name
+		if image, ok := images[key]; ok {
+			return image
+		}
+		image := &WorkloadImage{Namespace: ns, Kind: kind, Name: name, Container: container.Name, Init: init, Image: container.Image}
+		images[key] = image
+		order = append(order, key)
+		return image
+	}
+
+	for _, deployment := range deployments.Items {
+		spec := deployment.Spec.Template.Spec
+		for _, container := range spec.InitContainers {
+			add(deployment.Namespace, "Deployment", deployment.Name, container, true)
+		}
+		for _, container := range spec.Containers {
+			add(deployment.Namespace, "Deployment", deployment.Name, container, false)
+		}
+	}
+
+	// ReplicaSet namespace/name -> owning Deployment name
+	owners := make(map[string]string)
+	for _, rs := range replicaSets.Items {
+		for _, owner := range rs.OwnerReferences {
+			if owner.Kind == "Deployment" {
+				owners[rs.Namespace+"/"+rs.Name] = owner.Name
+			}
+		}
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		kind, name := "Pod", pod.Name
+		if len(pod.OwnerReferences) > 0 {
+			owner := pod.OwnerReferences[0]
+			kind, name = owner.Kind, owner.Name
+			if deployment, ok := owners[pod.Namespace+"/"+owner.Name]; ok && owner.Kind == "ReplicaSet" {
+				kind, name = "Deployment", deployment
+			}
+		}
+
+		statuses := make(map[string]string)
+		for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			statuses[status.Name] = imageDigest(status.ImageID)
+		}
+		for _, spec := range []struct {
+			containers []v1.Container
+			init       bool
+		}{{pod.Spec.InitContainers, true}, {pod.Spec.Containers, false}} {
+			for _, container := range spec.containers {
+				image := add(pod.Namespace, kind, name, container, spec.init)
+				if digest := statuses[container.Name]; digest != "" && !containsValue(image.Digests, digest) {
+					image.Digests = append(image.Digests, digest)
+				}
+			}
+		}
+	}
+
+	result := make([]WorkloadImage, 0, len(order))
+	for _, key := range order {
+		image := images[key]
+		sort.Strings(image.Digests)
+		result = append(result, *image)
+	}
+	return result, nil
+}
+
+// imageDigest extracts the sha256 digest from a container status image ID such as
+// docker-pullable://nginx@sha256:... or a bare sha256:...
+func imageDigest(imageID string) string {
+	if i := strings.LastIndex(imageID, "@"); i >= 0 {
+		imageID = imageID[i+1:]
+	}
+	imageID = strings.TrimPrefix(imageID, "docker://")
+	if strings.HasPrefix(imageID, "sha256:") {
+		return imageID
+	}
+	return ""
+}
@@ -0,0 +1,185 @@
+// Package k8s provides kube-state-metrics scraping
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrKubeStateMetricsNotFound is returned when no kube-state-metrics service exists in the cluster
+var ErrKubeStateMetricsNotFound = errors.New("kube-state-metrics not found")
+
+// kubeStateMetricsSelector matches the service installed by the kube-state-metrics Helm chart and manifests
+const kubeStateMetricsSelector = "app.kubernetes.io/name=kube-state-metrics"
+
+// KubeStateMetrics represents object states scraped from kube-state-metrics
+type KubeStateMetrics struct {
+	DeploymentCount            int32            `json:"deploymentCount"`
+	UnavailableDeploymentCount int32            `json:"unavailableDeploymentCount"`
+	CrashLoopPodCount          int32            `json:"crashLoopPodCount"`
+	FailedJobCount             int32            `json:"failedJobCount"`
+	PodPhases                  map[string]int32 `json:"podPhases"`
+}
+
+// ScrapeKubeStateMetrics discovers kube-state-metrics and scrapes it through the API server proxy
+func (c *ClusterClient) ScrapeKubeStateMetrics(ctx context.Context) (*KubeStateMetrics, error) {
+	services, err := c.clientset.CoreV1().Services("").List(ctx, metav1.ListOptions{
+		LabelSelector: kubeStateMetricsSelector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find kube-state-metrics: %w", err)
+	}
+	if len(services.Items) == 0 || len(services.Items[0].Spec.Ports) == 0 {
+		return nil, ErrKubeStateMetricsNotFound
+	}
+
+	svc := services.Items[0]
+	port := svc.Spec.Ports[0]
+	for _, p := range svc.Spec.Ports {
+		if p.Name == "http-metrics" || p.Name == "http" {
+			port = p
+			break
+		}
+	}
+
+	portName := strconv.Itoa(int(port.Port))
+	if port.Name != "" {
+		portName = port.Name
+	}
+
+	data, err := c.clientset.CoreV1().Services(svc.Namespace).
+		ProxyGet("http", svc.Name, portName, "/metrics", nil).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape kube-state-metrics: %w", err)
+	}
+
+	return parseKubeStateMetrics(data), nil
+}
+
+// parseKubeStateMetrics aggregates object states from the Prometheus text exposition format
+func parseKubeStateMetrics(data []byte) *KubeStateMetrics {
+	result := &KubeStateMetrics{PodPhases: make(map[string]int32)}
+	crashLoopPods := make(map[string]bool)
+	failedJobs := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		name, labels, value, ok := parseSample(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		switch name {
+		case "kube_deployment_status_replicas_unavailable":
+			result.DeploymentCount++
+			if value > 0 {
+				result.UnavailableDeploymentCount++
+			}
+		case "kube_pod_container_status_waiting_reason":
+			if value == 1 && labels["reason"] == "CrashLoopBackOff" {
+				crashLoopPods[labels["namespace"]+"/"+labels["pod"]] = true
+			}
+		case "kube_job_status_failed":
+			if value > 0 {
+				failedJobs[labels["namespace"]+"/"+labels["job_name"]] = true
+			}
+		case "kube_pod_status_phase":
+			if value == 1 {
+				result.PodPhases[labels["phase"]]++
+			}
+		}
+	}
+
+	result.CrashLoopPodCount = int32(len(crashLoopPods))
+	result.FailedJobCount = int32(len(failedJobs))
+	return result
+}
+
+// parseSample parses a sample line such as `name{a="b"} 1` and skips comments
+func parseSample(line string) (string, map[string]string, float64, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, 0, false
+	}
+
+	labels := make(map[string]string)
+	var name, rest string
+	if i := strings.IndexByte(line, '{'); i >= 0 {
+		name = line[:i]
+		end, ok := parseLabels(line[i+1:], labels)
+		if !ok {
+			return "", nil, 0, false
+		}
+		rest = line[i+1+end:]
+	} else {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return "", nil, 0, false
+		}
+		name = fields[0]
+		rest = strings.Join(fields[1:], " ")
+	}
+
+	// The value may be followed by a timestamp
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", nil, 0, false
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", nil, 0, false
+	}
+	return name, labels, value, true
+}
+
+// parseLabels parses `a="b",c="d"}` into labels and returns the index after the closing brace
+func parseLabels(s string, labels map[string]string) (int, bool) {
+	i := 0
+	for i < len(s) {
+		if s[i] == '}' {
+			return i + 1, true
+		}
+		if s[i] == ',' || s[i] == ' ' {
+			i++
+			continue
+		}
+
+		eq := strings.IndexByte(s[i:], '=')
+		if eq < 0 || i+eq+1 >= len(s) || s[i+eq+1] != '"' {
+			return 0, false
+		}
+		key := s[i : i+eq]
+		i += eq + 2
+
+		var value strings.Builder
+		for i < len(s) && s[i] != '"' {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+			} else {
+				value.WriteByte(s[i])
+			}
+			i++
+		}
+		if i >= len(s) {
+			return 0, false
+		}
+		labels[key] = value.String()
+		i++ // closing quote
+	}
+	return 0, false
+}
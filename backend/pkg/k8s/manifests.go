@@ -0,0 +1,298 @@
+// Package k8s provides applying, reading and deleting manifests of any kind
+package k8s
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+var (
+	// ErrUnknownKind is returned for manifests of kinds the cluster does not serve
+	ErrUnknownKind = errors.New("the cluster does not serve this kind")
+	// ErrNamespaceRequired is returned for namespaced manifests that name no namespace
+	ErrNamespaceRequired = errors.New("namespace is required")
+)
+
+// ObjectRef identifies a resource of any kind
+type ObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// String returns the reference as kind/namespace/name
+func (r ObjectRef) String() string {
+	if r.Namespace == "" {
+		return r.Kind + "/" + r.Name
+	}
+	return r.Kind + "/" + r.Namespace + "/" + r.Name
+}
+
+// RefOf returns the reference of a manifest
+func RefOf(object map[string]interface{}) ObjectRef {
+	ref := ObjectRef{}
+	ref.APIVersion, _ = object["apiVersion"].(string)
+	ref.Kind, _ = object["kind"].(string)
+	if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+		ref.Namespace, _ = metadata["namespace"].(string)
+		ref.Name, _ = metadata["name"].(string)
+	}
+	return ref
+}
+
+// ManifestClient applies manifests of any kind with server-side apply
+type ManifestClient struct {
+	cluster      *ClusterClient
+	client       dynamic.Interface
+	mapper       meta.RESTMapper
+	fieldManager string
+}
+
+// NewManifestClient returns a client that applies manifests as fieldManager.
+// It discovers the resources the cluster serves once; call Refresh after
+// applying custom resource definitions.
+func (c *ClusterClient) NewManifestClient(fieldManager string) (*ManifestClient, error) {
+	client, err := dynamic.NewForConfig(c.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	m := &ManifestClient{cluster: c, client: client, fieldManager: fieldManager}
+	if err := m.Refresh(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Refresh rediscovers the resources the cluster serves
+func (m *ManifestClient) Refresh() error {
+	groups, err := restmapper.GetAPIGroupResources(m.cluster.clientset.Discovery())
+	if err != nil && len(groups) == 0 {
+		return fmt.Errorf("failed to discover API resources: %w", err)
+	}
+	m.mapper = restmapper.NewDiscoveryRESTMapper(groups)
+	return nil
+}
+
+// Namespaced reports whether the cluster serves kind of apiVersion in namespaces
+func (m *ManifestClient) Namespaced(apiVersion, kind string) (bool, error) {
+	mapping, err := m.mapping(apiVersion, kind)
+	if err != nil {
+		return false, err
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+func (m *ManifestClient) mapping(apiVersion, kind string) (*meta.RESTMapping, error) {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid apiVersion %q: %w", apiVersion, err)
+	}
+	mapping, err := m.mapper.RESTMapping(gv.WithKind(kind).GroupKind(), gv.Version)
+	if meta.IsNoMatchError(err) {
+		return nil, fmt.Errorf("%s %s: %w", kind, apiVersion, ErrUnknownKind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to map %s %s: %w", kind, apiVersion, err)
+	}
+	return mapping, nil
+}
+
+func (m *ManifestClient) resource(ref ObjectRef) (dynamic.ResourceInterface, error) {
+	mapping, err := m.mapping(ref.APIVersion, ref.Kind)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return m.client.Resource(mapping.Resource), nil
+	}
+	if ref.Namespace == "" {
+		return nil, fmt.Errorf("%s: %w", ref, ErrNamespaceRequired)
+	}
+	return m.client.Resource(mapping.Resource).Namespace(ref.Namespace), nil
+}
+
+// Apply creates or updates object with server-side apply, taking over the
+// fields other managers set, and returns the object as the cluster stores it.
+// A dry run validates the object without persisting it.
+func (m *ManifestClient) Apply(ctx context.Context, object map[string]interface{}, dryRun bool) (map[string]interface{}, error) {
+	ref := RefOf(object)
+	res, err := m.resource(ref)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", ref, err)
+	}
+
+	force := true
+	opts := metav1.PatchOptions{FieldManager: m.fieldManager, Force: &force}
+	if dryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	applied, err := res.Patch(ctx, ref.Name, types.ApplyPatchType, data, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply %s: %w", ref, err)
+	}
+	return applied.Object, nil
+}
+
+// Get returns an object, or nil when it does not exist
+func (m *ManifestClient) Get(ctx context.Context, ref ObjectRef) (map[string]interface{}, error) {
+	res, err := m.resource(ref)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := res.Get(ctx, ref.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", ref, err)
+	}
+	return obj.Object, nil
+}
+
+// Delete deletes an object and leaves its dependents to the garbage
+// collector. Objects that are already gone are not an error.
+func (m *ManifestClient) Delete(ctx context.Context, ref ObjectRef) error {
+	res, err := m.resource(ref)
+	if errors.Is(err, ErrUnknownKind) {
+		return nil // Its definition went first
+	}
+	if err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	err = res.Delete(ctx, ref.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s: %w", ref, err)
+	}
+	return nil
+}
+
+// ManifestDrift lists the fields of desired whose live values differ, as
+// dotted paths. Fields only the cluster sets, such as defaults and status, are
+// not drift, and quantities compare by value so 0.5 and 500m are the same CPU.
+func ManifestDrift(desired, live map[string]interface{}) []string {
+	desired = secretStringData(desired)
+	drift := []string{}
+	for key, value := range desired {
+		if key == "status" {
+			continue
+		}
+		manifestDrift(&drift, key, value, live[key])
+	}
+	sort.Strings(drift)
+	return drift
+}
+
+func manifestDrift(drift *[]string, path string, desired, live interface{}) {
+	switch d := desired.(type) {
+	case nil:
+		// A null leaves the field to the cluster
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			if len(d) > 0 || live != nil {
+				*drift = append(*drift, path)
+			}
+			return
+		}
+		for key, value := range d {
+			manifestDrift(drift, path+"."+key, value, l[key])
+		}
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			if len(d) > 0 || live != nil {
+				*drift = append(*drift, path)
+			}
+			return
+		}
+		for i := range d {
+			manifestDrift(drift, fmt.Sprintf("%s[%d]", path, i), d[i], l[i])
+		}
+	default:
+		if !manifestValueEqual(d, live) {
+			*drift = append(*drift, path)
+		}
+	}
+}
+
+func manifestValueEqual(desired, live interface{}) bool {
+	if d, ok := manifestNumber(desired); ok {
+		if l, ok := manifestNumber(live); ok {
+			return d == l
+		}
+	}
+	if reflect.DeepEqual(desired, live) {
+		return true
+	}
+	// Quantities are stored in canonical form: 1024Mi is read back as 1Gi
+	_, dString := desired.(string)
+	_, lString := live.(string)
+	if !dString && !lString {
+		return false
+	}
+	d, err := resource.ParseQuantity(fmt.Sprint(desired))
+	if err != nil {
+		return false
+	}
+	l, err := resource.ParseQuantity(fmt.Sprint(live))
+	return err == nil && d.Cmp(l) == 0
+}
+
+func manifestNumber(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// secretStringData returns a Secret with its stringData moved to data, the way
+// the API server stores it
+func secretStringData(object map[string]interface{}) map[string]interface{} {
+	stringData, ok := object["stringData"].(map[string]interface{})
+	if !ok || object["kind"] != "Secret" {
+		return object
+	}
+	converted := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		converted[key] = value
+	}
+	delete(converted, "stringData")
+	data := map[string]interface{}{}
+	if existing, ok := object["data"].(map[string]interface{}); ok {
+		for key, value := range existing {
+			data[key] = value
+		}
+	}
+	for key, value := range stringData {
+		data[key] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(value)))
+	}
+	converted["data"] = data
+	return converted
+}
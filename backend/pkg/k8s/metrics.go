@@ -33,47 +33,79 @@ func NewMetricsClient(clientset *kubernetes.Clientset, config *rest.Config) (*Me
 	}, nil
 }
 
+// MetricsClient returns a metrics.k8s.io client sharing the cluster client's connection
+func (c *ClusterClient) MetricsClient() (*MetricsClient, error) {
+	return NewMetricsClient(c.clientset, c.config)
+}
+
 // ClusterMetrics represents cluster-level metrics
 type ClusterMetrics struct {
-	Timestamp        time.Time
-	CPUUsagePercent  float64
-	MemoryUsageBytes int64
-	MemoryTotalBytes int64
-	PodCount         int32
-	RunningPodCount  int32
-	PendingPodCount  int32
-	FailedPodCount   int32
-	NodeCount        int32
-	ReadyNodeCount   int32
+	Timestamp        time.Time `json:"timestamp"`
+	CPUUsagePercent  float64   `json:"cpuUsagePercent"`
+	MemoryUsageBytes int64     `json:"memoryUsageBytes"`
+	MemoryTotalBytes int64     `json:"memoryTotalBytes"`
+	PodCount         int32     `json:"podCount"`
+	RunningPodCount  int32     `json:"runningPodCount"`
+	PendingPodCount  int32     `json:"pendingPodCount"`
+	FailedPodCount   int32     `json:"failedPodCount"`
+	NodeCount        int32     `json:"nodeCount"`
+	ReadyNodeCount   int32     `json:"readyNodeCount"`
 }
 
 // NodeMetricsData represents node metrics with additional info
 type NodeMetricsData struct {
-	NodeName         string
-	Timestamp        time.Time
-	CPUUsagePercent  float64
-	MemoryUsageBytes int64
-	MemoryTotalBytes int64
-	DiskUsageBytes   int64
-	DiskTotalBytes   int64
-	PodCount         int32
-	NetworkRxBytes   int64
-	NetworkTxBytes   int64
-	Status           string
-	Ready            bool
+	NodeName         string    `json:"nodeName"`
+	Timestamp        time.Time `json:"timestamp"`
+	CPUUsagePercent  float64   `json:"cpuUsagePercent"`
+	MemoryUsageBytes int64     `json:"memoryUsageBytes"`
+	MemoryTotalBytes int64     `json:"memoryTotalBytes"`
+	DiskUsageBytes   int64     `json:"diskUsageBytes"`
+	DiskTotalBytes   int64     `json:"diskTotalBytes"`
+	PodCount         int32     `json:"podCount"`
+	NetworkRxBytes   int64     `json:"networkRxBytes"`
+	NetworkTxBytes   int64     `json:"networkTxBytes"`
+	Status           string    `json:"status"`
+	Ready            bool      `json:"ready"`
 }
 
 // PodMetricsData represents pod metrics with additional info
 type PodMetricsData struct {
-	Namespace        string
-	PodName          string
-	Timestamp        time.Time
-	CPUUsageCores    float64
-	MemoryUsageBytes int64
-	RestartCount     int32
-	Status           string
-	Ready            bool
-	NodeName         string
+	Namespace        string    `json:"namespace"`
+	PodName          string    `json:"podName"`
+	Timestamp        time.Time `json:"timestamp"`
+	CPUUsageCores    float64   `json:"cpuUsageCores"`
+	MemoryUsageBytes int64     `json:"memoryUsageBytes"`
+	RestartCount     int32     `json:"restartCount"`
+	Status           string    `json:"status"`
+	Ready            bool      `json:"ready"`
+	NodeName         string    `json:"nodeName"`
+}
+
+// PodUsage represents the current usage of a pod next to its requests and limits
+type PodUsage struct {
+	Timestamp          time.Time        `json:"timestamp"`
+	Window             string           `json:"window"`
+	CPUUsageCores      float64          `json:"cpuUsageCores"`
+	MemoryUsageBytes   int64            `json:"memoryUsageBytes"`
+	CPURequestCores    float64          `json:"cpuRequestCores"`
+	CPULimitCores      float64          `json:"cpuLimitCores"`
+	MemoryRequestBytes int64            `json:"memoryRequestBytes"`
+	MemoryLimitBytes   int64            `json:"memoryLimitBytes"`
+	Containers         []ContainerUsage `json:"containers"`
+}
+
+// ContainerUsage represents the current usage of a single container
+type ContainerUsage struct {
+	Name             string  `json:"name"`
+	CPUUsageCores    float64 `json:"cpuUsageCores"`
+	MemoryUsageBytes int64   `json:"memoryUsageBytes"`
+}
+
+// PodUsageSample represents one collected usage snapshot of a pod
+type PodUsageSample struct {
+	Timestamp        int64   `json:"timestamp"`
+	CPUUsageCores    float64 `json:"cpuUsageCores"`
+	MemoryUsageBytes int64   `json:"memoryUsageBytes"`
 }
 
 // GetClusterMetrics collects cluster-level metrics
@@ -285,6 +317,33 @@ func (m *MetricsClient) GetPodMetrics(ctx context.Context, namespace string) ([]
 	return result, nil
 }
 
+// GetPodUsage reads the current usage of a single pod
+func (m *MetricsClient) GetPodUsage(ctx context.Context, namespace, podName string) (*PodUsage, error) {
+	metric, err := m.metricsClientset.MetricsV1beta1().PodMetricses(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod metrics: %w", err)
+	}
+
+	usage := &PodUsage{
+		Timestamp:  metric.Timestamp.Time,
+		Window:     metric.Window.Duration.String(),
+		Containers: make([]ContainerUsage, 0, len(metric.Containers)),
+	}
+	for _, container := range metric.Containers {
+		cpu := float64(container.Usage.Cpu().MilliValue()) / 1000
+		memory := container.Usage.Memory().Value()
+		usage.CPUUsageCores += cpu
+		usage.MemoryUsageBytes += memory
+		usage.Containers = append(usage.Containers, ContainerUsage{
+			Name:             container.Name,
+			CPUUsageCores:    cpu,
+			MemoryUsageBytes: memory,
+		})
+	}
+
+	return usage, nil
+}
+
 // Helper functions
 
 func isNodeReady(node *corev1.Node) bool {
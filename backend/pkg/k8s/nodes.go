@@ -0,0 +1,193 @@
+// Package k8s provides node maintenance: cordoning, uncordoning and draining nodes
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// mirrorPodAnnotation marks the API copies of static pods, which cannot be evicted
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+	// evictionRetryInterval is how often an eviction a disruption budget refused is retried
+	evictionRetryInterval = 5 * time.Second
+	// drainPollInterval is how often evicted pods are checked for termination
+	drainPollInterval = 2 * time.Second
+)
+
+// DrainOptions controls which pods a drain evicts and how
+type DrainOptions struct {
+	GracePeriodSeconds *int64        // Overrides the pods' termination grace period
+	IgnoreDaemonSets   bool          // Leave DaemonSet pods running; the drain is refused otherwise
+	DeleteEmptyDirData bool          // Evict pods with emptyDir volumes, whose data is lost
+	Force              bool          // Evict pods no controller will recreate
+	Timeout            time.Duration // How long to wait for the node to empty; no limit when 0
+}
+
+// DrainProgress is told how far a drain is, from 0 to 100 percent
+type DrainProgress func(percent int, message string)
+
+// DrainResult is what a drain evicted and left running
+type DrainResult struct {
+	Node    string   `json:"node"`
+	Evicted []string `json:"evicted"`           // namespace/name
+	Skipped []string `json:"skipped,omitempty"` // DaemonSet and static pods left running
+}
+
+// CordonNode marks a node unschedulable so no new pods are placed on it
+func (c *ClusterClient) CordonNode(ctx context.Context, name string) error {
+	return c.setUnschedulable(ctx, name, true)
+}
+
+// UncordonNode makes a node schedulable again
+func (c *ClusterClient) UncordonNode(ctx context.Context, name string) error {
+	return c.setUnschedulable(ctx, name, false)
+}
+
+func (c *ClusterClient) setUnschedulable(ctx context.Context, name string, unschedulable bool) error {
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	if _, err := c.clientset.CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("node %s not found", name)
+		}
+		return fmt.Errorf("failed to update node %s: %w", name, err)
+	}
+	return nil
+}
+
+// DrainNode cordons a node and evicts its pods through the Eviction API, so
+// PodDisruptionBudgets are respected, then waits for them to terminate, like
+// kubectl drain. Evictions a budget refuses are retried until opts.Timeout.
+// Pods the options do not allow evicting refuse the drain before anything is
+// evicted. Once the node is cordoned a result is returned even when the drain
+// fails, and the node stays cordoned.
+func (c *ClusterClient) DrainNode(ctx context.Context, name string, opts DrainOptions, progress DrainProgress) (*DrainResult, error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	if progress == nil {
+		progress = func(int, string) {}
+	}
+
+	if err := c.CordonNode(ctx, name); err != nil {
+		return nil, err
+	}
+	result := &DrainResult{Node: name, Evicted: []string{}}
+	pods, err := c.clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", name).String(),
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to list pods on node %s: %w", name, err)
+	}
+
+	var evict []corev1.Pod
+	var refused []string
+	for _, pod := range pods.Items {
+		skip, reason := drainFilter(&pod, opts)
+		switch {
+		case reason != "":
+			refused = append(refused, fmt.Sprintf("%s/%s (%s)", pod.Namespace, pod.Name, reason))
+		case skip:
+			result.Skipped = append(result.Skipped, pod.Namespace+"/"+pod.Name)
+		default:
+			evict = append(evict, pod)
+		}
+	}
+	if len(refused) > 0 {
+		return result, fmt.Errorf("cannot drain node %s: %s", name, strings.Join(refused, ", "))
+	}
+
+	progress(0, fmt.Sprintf("Evicting %d pods from %s", len(evict), name))
+	for _, pod := range evict {
+		if err := c.evictPod(ctx, &pod, opts.GracePeriodSeconds); err != nil {
+			return result, err
+		}
+		result.Evicted = append(result.Evicted, pod.Namespace+"/"+pod.Name)
+		progress(len(result.Evicted)*50/len(evict), fmt.Sprintf("Evicted %d of %d pods from %s", len(result.Evicted), len(evict), name))
+	}
+
+	// Evicted pods terminate within their grace period; wait until every one is gone
+	for len(evict) > 0 {
+		remaining := 0
+		for _, pod := range evict {
+			current, err := c.clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+			if err == nil && current.UID == pod.UID {
+				remaining++
+			} else if err != nil && !apierrors.IsNotFound(err) {
+				return result, fmt.Errorf("failed to get pod %s/%s: %w", pod.Namespace, pod.Name, err)
+			}
+		}
+		if remaining == 0 {
+			break
+		}
+		progress(50+(len(evict)-remaining)*50/len(evict), fmt.Sprintf("%d of %d evicted pods terminated on %s", len(evict)-remaining, len(evict), name))
+		select {
+		case <-ctx.Done():
+			return result, fmt.Errorf("timed out waiting for %d pods to terminate on node %s", remaining, name)
+		case <-time.After(drainPollInterval):
+		}
+	}
+	return result, nil
+}
+
+// drainFilter decides what a drain does with a pod: skip leaves it running,
+// and a reason refuses the drain
+func drainFilter(pod *corev1.Pod, opts DrainOptions) (skip bool, reason string) {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false, "" // Finished pods are evicted regardless, as kubectl does
+	}
+	if _, mirror := pod.Annotations[mirrorPodAnnotation]; mirror {
+		return true, ""
+	}
+	controller := metav1.GetControllerOf(pod)
+	if controller != nil && controller.Kind == "DaemonSet" {
+		if opts.IgnoreDaemonSets {
+			return true, ""
+		}
+		return false, "managed by a DaemonSet"
+	}
+	if controller == nil && !opts.Force {
+		return false, "not managed by a controller"
+	}
+	if !opts.DeleteEmptyDirData {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.EmptyDir != nil {
+				return false, "uses emptyDir data"
+			}
+		}
+	}
+	return false, ""
+}
+
+// evictPod evicts a pod, retrying while a disruption budget refuses it
+func (c *ClusterClient) evictPod(ctx context.Context, pod *corev1.Pod, gracePeriod *int64) error {
+	eviction := &policyv1.Eviction{
+		ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		DeleteOptions: &metav1.DeleteOptions{GracePeriodSeconds: gracePeriod},
+	}
+	for {
+		err := c.clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+		switch {
+		case err == nil, apierrors.IsNotFound(err):
+			return nil
+		case !apierrors.IsTooManyRequests(err):
+			return fmt.Errorf("failed to evict pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out evicting pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		case <-time.After(evictionRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Package k8s provides Kubernetes port-forward operations
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// PortForwardTarget is the pod port a service port is forwarded to
+type PortForwardTarget struct {
+	PodName string `json:"podName"`
+	Port    int32  `json:"port"`
+}
+
+// PortForwardConn is a single TCP connection to a pod port, tunnelled through the
+// API server
+type PortForwardConn struct {
+	conn httpstream.Connection
+	data httpstream.Stream
+
+	closeOnce sync.Once
+	errDone   chan struct{}
+	err       error
+}
+
+// DialPodPort opens a TCP connection to port of a pod. The connection is closed
+// when ctx is cancelled.
+func (c *ClusterClient) DialPodPort(ctx context.Context, namespace, podName string, port int32) (*PortForwardConn, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(c.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create round tripper: %w", err)
+	}
+
+	req := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("portforward")
+
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+	conn, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade connection: %w", err)
+	}
+
+	// Every connection needs an error stream next to its data stream
+	headers := http.Header{}
+	headers.Set(v1.StreamType, v1.StreamTypeError)
+	headers.Set(v1.PortHeader, strconv.Itoa(int(port)))
+	headers.Set(v1.PortForwardRequestIDHeader, "0")
+	errorStream, err := conn.CreateStream(headers)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create error stream: %w", err)
+	}
+	// The error stream is only read from
+	errorStream.Close()
+
+	headers.Set(v1.StreamType, v1.StreamTypeData)
+	dataStream, err := conn.CreateStream(headers)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create data stream: %w", err)
+	}
+
+	pf := &PortForwardConn{
+		conn:    conn,
+		data:    dataStream,
+		errDone: make(chan struct{}),
+	}
+	go func() {
+		defer close(pf.errDone)
+		message, err := io.ReadAll(errorStream)
+		switch {
+		case err != nil:
+			pf.err = fmt.Errorf("failed to read error stream: %w", err)
+		case len(message) > 0:
+			pf.err = fmt.Errorf("port forward to %s/%s:%d failed: %s", namespace, podName, port, strings.TrimSpace(string(message)))
+		}
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			pf.Close()
+		case <-conn.CloseChan():
+		}
+	}()
+
+	return pf, nil
+}
+
+// Read reads from the pod port
+func (pf *PortForwardConn) Read(p []byte) (int, error) {
+	return pf.data.Read(p)
+}
+
+// Write writes to the pod port
+func (pf *PortForwardConn) Write(p []byte) (int, error) {
+	return pf.data.Write(p)
+}
+
+// CloseWrite tells the pod no more data is sent, keeping the read side open
+func (pf *PortForwardConn) CloseWrite() error {
+	return pf.data.Close()
+}
+
+// Close closes the connection to the pod port
+func (pf *PortForwardConn) Close() error {
+	var err error
+	pf.closeOnce.Do(func() {
+		pf.data.Reset()
+		err = pf.conn.Close()
+	})
+	return err
+}
+
+// Err returns the error the API server reported for the connection, if any. It
+// is only complete once the connection is closed.
+func (pf *PortForwardConn) Err() error {
+	select {
+	case <-pf.errDone:
+		return pf.err
+	default:
+		return nil
+	}
+}
+
+// ResolveServicePort picks a ready pod behind a service and the pod port its port
+// is forwarded to. port may be 0 for a service with a single port.
+func (c *ClusterClient) ResolveServicePort(ctx context.Context, namespace, serviceName string, port int32) (*PortForwardTarget, error) {
+	svc, err := c.clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return nil, fmt.Errorf("service %s has no selector", serviceName)
+	}
+
+	var servicePort *v1.ServicePort
+	for i := range svc.Spec.Ports {
+		if svc.Spec.Ports[i].Port == port || (port == 0 && len(svc.Spec.Ports) == 1) {
+			servicePort = &svc.Spec.Ports[i]
+			break
+		}
+	}
+	if servicePort == nil {
+		return nil, fmt.Errorf("service %s has no port %d", serviceName, port)
+	}
+
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+		FieldSelector: "status.phase=Running",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || !isPodReady(pod) {
+			continue
+		}
+		if podPort, ok := targetPodPort(pod, servicePort); ok {
+			return &PortForwardTarget{PodName: pod.Name, Port: podPort}, nil
+		}
+	}
+	return nil, fmt.Errorf("service %s has no ready pods", serviceName)
+}
+
+// targetPodPort resolves the target port of a service port on a pod, looking up
+// named ports in the pod's containers
+func targetPodPort(pod *v1.Pod, servicePort *v1.ServicePort) (int32, bool) {
+	switch {
+	case servicePort.TargetPort.Type == intstr.String:
+		for _, container := range pod.Spec.Containers {
+			for _, containerPort := range container.Ports {
+				if containerPort.Name == servicePort.TargetPort.StrVal {
+					return containerPort.ContainerPort, true
+				}
+			}
+		}
+		return 0, false
+	case servicePort.TargetPort.IntVal != 0:
+		return servicePort.TargetPort.IntVal, true
+	default:
+		return servicePort.Port, true
+	}
+}
@@ -0,0 +1,537 @@
+// Package k8s provides inspection and generation of Kubernetes RBAC
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/yaml"
+)
+
+// RBACRule is one rule of a Role or ClusterRole
+type RBACRule struct {
+	APIGroups       []string `json:"apiGroups,omitempty"`
+	Resources       []string `json:"resources,omitempty"`
+	ResourceNames   []string `json:"resourceNames,omitempty"`
+	NonResourceURLs []string `json:"nonResourceURLs,omitempty"`
+	Verbs           []string `json:"verbs"`
+}
+
+// RBACRole summarizes a Role or ClusterRole
+type RBACRole struct {
+	Kind       string     `json:"kind"`
+	Name       string     `json:"name"`
+	Namespace  string     `json:"namespace,omitempty"`
+	Rules      []RBACRule `json:"rules"`
+	Aggregated bool       `json:"aggregated,omitempty"` // Rules are aggregated from other ClusterRoles
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// RBACSubject is a user, group or service account a binding grants a role to
+type RBACSubject struct {
+	Kind      string `json:"kind"` // User, Group or ServiceAccount
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// RBACBinding summarizes a RoleBinding or ClusterRoleBinding
+type RBACBinding struct {
+	Kind      string        `json:"kind"`
+	Name      string        `json:"name"`
+	Namespace string        `json:"namespace,omitempty"`
+	RoleKind  string        `json:"roleKind"`
+	RoleName  string        `json:"roleName"`
+	Subjects  []RBACSubject `json:"subjects"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// RBACSummary lists the RBAC objects of a cluster
+type RBACSummary struct {
+	Roles               []RBACRole    `json:"roles"`
+	ClusterRoles        []RBACRole    `json:"clusterRoles"`
+	RoleBindings        []RBACBinding `json:"roleBindings"`
+	ClusterRoleBindings []RBACBinding `json:"clusterRoleBindings"`
+}
+
+// ResourceAttributes names an action on a resource, as in a SubjectAccessReview
+type ResourceAttributes struct {
+	Verb        string `json:"verb"`
+	Group       string `json:"group"` // "" is the core group
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Namespace   string `json:"namespace,omitempty"` // "" for cluster-scoped resources or all namespaces
+}
+
+// AccessGrant is a subject allowed an action and the binding that allows it
+type AccessGrant struct {
+	Subject          RBACSubject `json:"subject"`
+	BindingKind      string      `json:"bindingKind"`
+	BindingName      string      `json:"bindingName"`
+	BindingNamespace string      `json:"bindingNamespace,omitempty"`
+	RoleKind         string      `json:"roleKind"`
+	RoleName         string      `json:"roleName"`
+}
+
+// AccessReview asks whether a subject may perform an action
+type AccessReview struct {
+	Subject RBACSubject `json:"subject"`
+	Groups  []string    `json:"groups,omitempty"` // Extra groups of a User subject
+	ResourceAttributes
+}
+
+// AccessReviewResult is the API server's answer to an AccessReview
+type AccessReviewResult struct {
+	Allowed         bool   `json:"allowed"`
+	Denied          bool   `json:"denied"` // Explicitly denied rather than not allowed
+	Reason          string `json:"reason,omitempty"`
+	EvaluationError string `json:"evaluationError,omitempty"`
+}
+
+// RolePermission is a permission a generated role grants
+type RolePermission struct {
+	Group         string   `json:"group"` // "" is the core group
+	Resource      string   `json:"resource"`
+	Verbs         []string `json:"verbs"`
+	ResourceNames []string `json:"resourceNames,omitempty"`
+}
+
+// RoleRequest describes a role to generate and who to bind it to. Without a
+// namespace a ClusterRole and ClusterRoleBinding are generated.
+type RoleRequest struct {
+	Name        string           `json:"name"`
+	Namespace   string           `json:"namespace"`
+	Permissions []RolePermission `json:"permissions"`
+	Subjects    []RBACSubject    `json:"subjects"`
+}
+
+// ListRBAC lists the Roles and RoleBindings of namespace, of every namespace when it
+// is empty, and all ClusterRoles and ClusterRoleBindings. Objects named system: are
+// left out unless includeSystem is set.
+func (c *ClusterClient) ListRBAC(ctx context.Context, namespace string, includeSystem bool) (*RBACSummary, error) {
+	rbac := c.clientset.RbacV1()
+	roles, err := rbac.Roles(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	clusterRoles, err := rbac.ClusterRoles().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cluster roles: %w", err)
+	}
+	bindings, err := rbac.RoleBindings(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list role bindings: %w", err)
+	}
+	clusterBindings, err := rbac.ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cluster role bindings: %w", err)
+	}
+
+	skip := func(name string) bool {
+		return !includeSystem && strings.HasPrefix(name, "system:")
+	}
+	summary := &RBACSummary{
+		Roles:               []RBACRole{},
+		ClusterRoles:        []RBACRole{},
+		RoleBindings:        []RBACBinding{},
+		ClusterRoleBindings: []RBACBinding{},
+	}
+	for _, role := range roles.Items {
+		if !skip(role.Name) {
+			summary.Roles = append(summary.Roles, RBACRole{
+				Kind:      "Role",
+				Name:      role.Name,
+				Namespace: role.Namespace,
+				Rules:     rbacRules(role.Rules),
+				CreatedAt: role.CreationTimestamp.Time,
+			})
+		}
+	}
+	for _, role := range clusterRoles.Items {
+		if !skip(role.Name) {
+			summary.ClusterRoles = append(summary.ClusterRoles, RBACRole{
+				Kind:       "ClusterRole",
+				Name:       role.Name,
+				Rules:      rbacRules(role.Rules),
+				Aggregated: role.AggregationRule != nil,
+				CreatedAt:  role.CreationTimestamp.Time,
+			})
+		}
+	}
+	for _, binding := range bindings.Items {
+		if !skip(binding.Name) {
+			summary.RoleBindings = append(summary.RoleBindings, rbacBinding("RoleBinding", binding.ObjectMeta, binding.RoleRef, binding.Subjects))
+		}
+	}
+	for _, binding := range clusterBindings.Items {
+		if !skip(binding.Name) {
+			summary.ClusterRoleBindings = append(summary.ClusterRoleBindings, rbacBinding("ClusterRoleBinding", binding.ObjectMeta, binding.RoleRef, binding.Subjects))
+		}
+	}
+	return summary, nil
+}
+
+// WhoCan evaluates the cluster's bindings to find every subject allowed the action,
+// like kubectl who-can. It only sees RBAC; other authorizers, such as node
+// authorization or webhooks, may allow more.
+func (c *ClusterClient) WhoCan(ctx context.Context, attrs *ResourceAttributes) ([]AccessGrant, error) {
+	rbac := c.clientset.RbacV1()
+	clusterRoles, err := rbac.ClusterRoles().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cluster roles: %w", err)
+	}
+	clusterRules := make(map[string][]rbacv1.PolicyRule, len(clusterRoles.Items))
+	for _, role := range clusterRoles.Items {
+		clusterRules[role.Name] = role.Rules
+	}
+
+	grants := []AccessGrant{}
+	grant := func(kind string, meta metav1.ObjectMeta, ref rbacv1.RoleRef, subjects []rbacv1.Subject) {
+		for _, subject := range subjects {
+			grants = append(grants, AccessGrant{
+				Subject:          rbacSubject(subject, meta.Namespace),
+				BindingKind:      kind,
+				BindingName:      meta.Name,
+				BindingNamespace: meta.Namespace,
+				RoleKind:         ref.Kind,
+				RoleName:         ref.Name,
+			})
+		}
+	}
+
+	clusterBindings, err := rbac.ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cluster role bindings: %w", err)
+	}
+	for _, binding := range clusterBindings.Items {
+		if binding.RoleRef.Kind == "ClusterRole" && rulesAllow(clusterRules[binding.RoleRef.Name], attrs) {
+			grant("ClusterRoleBinding", binding.ObjectMeta, binding.RoleRef, binding.Subjects)
+		}
+	}
+
+	// Bindings in a namespace apply to namespaced resources of that namespace only
+	if attrs.Namespace != "" {
+		roles, err := rbac.Roles(attrs.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list roles: %w", err)
+		}
+		roleRules := make(map[string][]rbacv1.PolicyRule, len(roles.Items))
+		for _, role := range roles.Items {
+			roleRules[role.Name] = role.Rules
+		}
+		bindings, err := rbac.RoleBindings(attrs.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list role bindings: %w", err)
+		}
+		for _, binding := range bindings.Items {
+			rules := roleRules[binding.RoleRef.Name]
+			if binding.RoleRef.Kind == "ClusterRole" {
+				rules = clusterRules[binding.RoleRef.Name]
+			}
+			if rulesAllow(rules, attrs) {
+				grant("RoleBinding", binding.ObjectMeta, binding.RoleRef, binding.Subjects)
+			}
+		}
+	}
+
+	sort.SliceStable(grants, func(i, j int) bool {
+		if grants[i].Subject.Kind != grants[j].Subject.Kind {
+			return grants[i].Subject.Kind < grants[j].Subject.Kind
+		}
+		return grants[i].Subject.Name < grants[j].Subject.Name
+	})
+	return grants, nil
+}
+
+// ReviewAccess asks the API server whether the subject may perform the action,
+// taking every authorizer of the cluster into account
+func (c *ClusterClient) ReviewAccess(ctx context.Context, review *AccessReview) (*AccessReviewResult, error) {
+	spec := authorizationv1.SubjectAccessReviewSpec{
+		ResourceAttributes: &authorizationv1.ResourceAttributes{
+			Namespace:   review.Namespace,
+			Verb:        review.Verb,
+			Group:       review.Group,
+			Resource:    review.Resource,
+			Subresource: review.Subresource,
+			Name:        review.Name,
+		},
+	}
+	switch review.Subject.Kind {
+	case rbacv1.UserKind:
+		spec.User, spec.Groups = review.Subject.Name, review.Groups
+	case rbacv1.GroupKind:
+		spec.Groups = append([]string{review.Subject.Name}, review.Groups...)
+	case rbacv1.ServiceAccountKind:
+		spec.User = "system:serviceaccount:" + review.Subject.Namespace + ":" + review.Subject.Name
+		spec.Groups = []string{"system:serviceaccounts", "system:serviceaccounts:" + review.Subject.Namespace, "system:authenticated"}
+	default:
+		return nil, fmt.Errorf("unknown subject kind %q", review.Subject.Kind)
+	}
+
+	result, err := c.clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx,
+		&authorizationv1.SubjectAccessReview{Spec: spec}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to review access: %w", err)
+	}
+	return &AccessReviewResult{
+		Allowed:         result.Status.Allowed,
+		Denied:          result.Status.Denied,
+		Reason:          result.Status.Reason,
+		EvaluationError: result.Status.EvaluationError,
+	}, nil
+}
+
+// ValidatePermissions checks each permission names a resource the cluster serves and
+// a verb the resource supports, returning the problems found
+func (c *ClusterClient) ValidatePermissions(permissions []RolePermission) ([]string, error) {
+	_, lists, err := c.clientset.Discovery().ServerGroupsAndResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, fmt.Errorf("failed to discover API resources: %w", err)
+	}
+	verbs := make(map[schema.GroupResource]map[string]bool)
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, resource := range list.APIResources {
+			key := schema.GroupResource{Group: gv.Group, Resource: resource.Name}
+			if verbs[key] == nil {
+				verbs[key] = make(map[string]bool)
+			}
+			for _, verb := range resource.Verbs {
+				verbs[key][verb] = true
+			}
+		}
+	}
+
+	var problems []string
+	for _, permission := range permissions {
+		if permission.Resource == "*" || permission.Group == "*" {
+			continue
+		}
+		supported, ok := verbs[schema.GroupResource{Group: permission.Group, Resource: permission.Resource}]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("resource %s is not served by the cluster", groupResource(permission.Group, permission.Resource)))
+			continue
+		}
+		for _, verb := range permission.Verbs {
+			if verb != "*" && !supported[verb] {
+				problems = append(problems, fmt.Sprintf("resource %s does not support %s", groupResource(permission.Group, permission.Resource), verb))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// GenerateRoleManifest renders the smallest Role and RoleBinding, or ClusterRole and
+// ClusterRoleBinding, granting the permissions to the subjects; see policyRules.
+func GenerateRoleManifest(req *RoleRequest) (string, error) {
+	if req.Name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	if len(req.Permissions) == 0 {
+		return "", fmt.Errorf("at least one permission is required")
+	}
+	for _, permission := range req.Permissions {
+		if permission.Resource == "" || len(uniqueSorted(permission.Verbs)) == 0 {
+			return "", fmt.Errorf("every permission needs a resource and verbs")
+		}
+	}
+	for _, subject := range req.Subjects {
+		switch {
+		case subject.Name == "":
+			return "", fmt.Errorf("every subject needs a name")
+		case subject.Kind != rbacv1.UserKind && subject.Kind != rbacv1.GroupKind && subject.Kind != rbacv1.ServiceAccountKind:
+			return "", fmt.Errorf("unknown subject kind %q", subject.Kind)
+		case subject.Kind == rbacv1.ServiceAccountKind && subject.Namespace == "" && req.Namespace == "":
+			return "", fmt.Errorf("service account %s needs a namespace", subject.Name)
+		}
+	}
+
+	policy := policyRules(req.Permissions)
+
+	subjects := make([]rbacv1.Subject, 0, len(req.Subjects))
+	for _, subject := range req.Subjects {
+		s := rbacv1.Subject{Kind: subject.Kind, Name: subject.Name}
+		switch subject.Kind {
+		case rbacv1.ServiceAccountKind:
+			s.Namespace = subject.Namespace
+			if s.Namespace == "" {
+				s.Namespace = req.Namespace
+			}
+		default:
+			s.APIGroup = rbacv1.GroupName
+		}
+		subjects = append(subjects, s)
+	}
+
+	roleKind, bindingKind := "Role", "RoleBinding"
+	if req.Namespace == "" {
+		roleKind, bindingKind = "ClusterRole", "ClusterRoleBinding"
+	}
+	meta := metav1.ObjectMeta{
+		Name:      req.Name,
+		Namespace: req.Namespace,
+		Labels:    map[string]string{"app.kubernetes.io/managed-by": "myops"},
+	}
+	objects := []interface{}{
+		&rbacv1.Role{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: roleKind},
+			ObjectMeta: meta,
+			Rules:      policy,
+		},
+	}
+	if len(subjects) > 0 {
+		objects = append(objects, &rbacv1.RoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: bindingKind},
+			ObjectMeta: meta,
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: roleKind, Name: req.Name},
+			Subjects:   subjects,
+		})
+	}
+
+	// A ClusterRole has the same fields as a Role, so both render from rbacv1.Role
+	docs := make([]string, 0, len(objects))
+	for _, object := range objects {
+		data, err := yaml.Marshal(object)
+		if err != nil {
+			return "", fmt.Errorf("failed to render manifest: %w", err)
+		}
+		docs = append(docs, strings.Replace(string(data), "  creationTimestamp: null\n", "", 1))
+	}
+	return strings.Join(docs, "---\n"), nil
+}
+
+// policyRules merges permissions into the fewest rules: permissions with the
+// same group, verbs and resource names share a rule
+func policyRules(permissions []RolePermission) []rbacv1.PolicyRule {
+	type ruleKey struct{ group, verbs, names string }
+	rules := make(map[ruleKey]*rbacv1.PolicyRule)
+	var order []ruleKey
+	for _, permission := range permissions {
+		verbs := uniqueSorted(permission.Verbs)
+		names := uniqueSorted(permission.ResourceNames)
+		key := ruleKey{permission.Group, strings.Join(verbs, ","), strings.Join(names, ",")}
+		rule, ok := rules[key]
+		if !ok {
+			rule = &rbacv1.PolicyRule{APIGroups: []string{permission.Group}, Verbs: verbs, ResourceNames: names}
+			rules[key] = rule
+			order = append(order, key)
+		}
+		if !containsValue(rule.Resources, permission.Resource) {
+			rule.Resources = append(rule.Resources, permission.Resource)
+		}
+	}
+	policy := make([]rbacv1.PolicyRule, 0, len(order))
+	for _, key := range order {
+		rule := rules[key]
+		sort.Strings(rule.Resources)
+		policy = append(policy, *rule)
+	}
+	return policy
+}
+
+// rulesAllow reports whether any of the rules allows the action
+func rulesAllow(rules []rbacv1.PolicyRule, attrs *ResourceAttributes) bool {
+	resource := attrs.Resource
+	if attrs.Subresource != "" {
+		resource += "/" + attrs.Subresource
+	}
+	for _, rule := range rules {
+		if !matchesValue(rule.Verbs, attrs.Verb) || !matchesValue(rule.APIGroups, attrs.Group) {
+			continue
+		}
+		if !matchesValue(rule.Resources, resource) && !(attrs.Subresource != "" && containsValue(rule.Resources, "*/"+attrs.Subresource)) {
+			continue
+		}
+		if len(rule.ResourceNames) > 0 && (attrs.Name == "" || !containsValue(rule.ResourceNames, attrs.Name)) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// matchesValue reports whether values holds value or the * wildcard
+func matchesValue(values []string, value string) bool {
+	return containsValue(values, "*") || containsValue(values, value)
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueSorted returns the distinct non-empty values in order
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var result []string
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func groupResource(group, resource string) string {
+	if group == "" {
+		return resource
+	}
+	return resource + "." + group
+}
+
+func rbacRules(rules []rbacv1.PolicyRule) []RBACRule {
+	result := make([]RBACRule, len(rules))
+	for i, rule := range rules {
+		result[i] = RBACRule{
+			APIGroups:       rule.APIGroups,
+			Resources:       rule.Resources,
+			ResourceNames:   rule.ResourceNames,
+			NonResourceURLs: rule.NonResourceURLs,
+			Verbs:           rule.Verbs,
+		}
+	}
+	return result
+}
+
+func rbacBinding(kind string, meta metav1.ObjectMeta, ref rbacv1.RoleRef, subjects []rbacv1.Subject) RBACBinding {
+	binding := RBACBinding{
+		Kind:      kind,
+		Name:      meta.Name,
+		Namespace: meta.Namespace,
+		RoleKind:  ref.Kind,
+		RoleName:  ref.Name,
+		Subjects:  make([]RBACSubject, len(subjects)),
+		CreatedAt: meta.CreationTimestamp.Time,
+	}
+	for i, subject := range subjects {
+		binding.Subjects[i] = rbacSubject(subject, meta.Namespace)
+	}
+	return binding
+}
+
+// rbacSubject converts a binding subject; service accounts without a namespace
+// default to the binding's
+func rbacSubject(subject rbacv1.Subject, namespace string) RBACSubject {
+	result := RBACSubject{Kind: subject.Kind, Name: subject.Name, Namespace: subject.Namespace}
+	if subject.Kind == rbacv1.ServiceAccountKind && result.Namespace == "" {
+		result.Namespace = namespace
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+// Package k8s provides resource request and allocatable capacity queries
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// instanceTypeLabel is the well-known node label set by cloud providers
+const instanceTypeLabel = "node.kubernetes.io/instance-type"
+
+// PodResources represents the resource requests and limits of a running pod
+type PodResources struct {
+	Namespace          string            `json:"namespace"`
+	PodName            string            `json:"podName"`
+	NodeName           string            `json:"nodeName"`
+	WorkloadKind       string            `json:"workloadKind,omitempty"`
+	WorkloadName       string            `json:"workloadName,omitempty"`
+	Labels             map[string]string `json:"labels,omitempty"`
+	CPURequestCores    float64           `json:"cpuRequestCores"`
+	CPULimitCores      float64           `json:"cpuLimitCores"`
+	MemoryRequestBytes int64             `json:"memoryRequestBytes"`
+	MemoryLimitBytes   int64             `json:"memoryLimitBytes"`
+}
+
+// NodeCapacity represents the allocatable resources of a node
+type NodeCapacity struct {
+	NodeName               string  `json:"nodeName"`
+	InstanceType           string  `json:"instanceType,omitempty"`
+	CPUAllocatableCores    float64 `json:"cpuAllocatableCores"`
+	MemoryAllocatableBytes int64   `json:"memoryAllocatableBytes"`
+	Ready                  bool    `json:"ready"`
+}
+
+// GetPodResources returns the requests and limits of running pods. Pods owned by a
+// ReplicaSet are attributed to its Deployment.
+func (c *ClusterClient) GetPodResources(ctx context.Context, namespace string) ([]PodResources, error) {
+	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "status.phase=Running",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	replicaSets, err := c.clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replica sets: %w", err)
+	}
+
+	// ReplicaSet namespace/name -> owning Deployment name
+	deployments := make(map[string]string)
+	for _, rs := range replicaSets.Items {
+		for _, owner := range rs.OwnerReferences {
+			if owner.Kind == "Deployment" {
+				deployments[rs.Namespace+"/"+rs.Name] = owner.Name
+			}
+		}
+	}
+
+	result := make([]PodResources, 0, len(pods.Items))
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		res := PodResources{
+			Namespace: pod.Namespace,
+			PodName:   pod.Name,
+			NodeName:  pod.Spec.NodeName,
+			Labels:    pod.Labels,
+		}
+
+		if len(pod.OwnerReferences) > 0 {
+			owner := pod.OwnerReferences[0]
+			res.WorkloadKind = owner.Kind
+			res.WorkloadName = owner.Name
+			if owner.Kind == "ReplicaSet" {
+				if name, ok := deployments[pod.Namespace+"/"+owner.Name]; ok {
+					res.WorkloadKind = "Deployment"
+					res.WorkloadName = name
+				}
+			}
+		}
+
+		for _, container := range pod.Spec.Containers {
+			res.CPURequestCores += float64(container.Resources.Requests.Cpu().MilliValue()) / 1000
+			res.CPULimitCores += float64(container.Resources.Limits.Cpu().MilliValue()) / 1000
+			res.MemoryRequestBytes += container.Resources.Requests.Memory().Value()
+			res.MemoryLimitBytes += container.Resources.Limits.Memory().Value()
+		}
+
+		result = append(result, res)
+	}
+
+	return result, nil
+}
+
+// GetNodeCapacities returns the allocatable CPU and memory of all nodes
+func (c *ClusterClient) GetNodeCapacities(ctx context.Context) ([]NodeCapacity, error) {
+	nodes, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	result := make([]NodeCapacity, len(nodes.Items))
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		result[i] = NodeCapacity{
+			NodeName:               node.Name,
+			InstanceType:           node.Labels[instanceTypeLabel],
+			CPUAllocatableCores:    float64(node.Status.Allocatable.Cpu().MilliValue()) / 1000,
+			MemoryAllocatableBytes: node.Status.Allocatable.Memory().Value(),
+			Ready:                  isNodeReady(node),
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,166 @@
+// Package k8s provides deployment rollout and scaling actions
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// RestartDeployment rolls a deployment's pods, like kubectl rollout restart
+func (c *ClusterClient) RestartDeployment(ctx context.Context, namespace, name string) error {
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":%q}}}}}`,
+		time.Now().UTC().Format(time.RFC3339))
+	if _, err := c.clientset.AppsV1().Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to restart deployment: %w", err)
+	}
+	return nil
+}
+
+// ScaleDeployment adds by replicas to a deployment, up to max when max is
+// positive, and returns the replica counts before and after. A deployment
+// already at max is left alone.
+func (c *ClusterClient) ScaleDeployment(ctx context.Context, namespace, name string, by, max int32) (from, to int32, err error) {
+	deployments := c.clientset.AppsV1().Deployments(namespace)
+	scale, err := deployments.GetScale(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get deployment scale: %w", err)
+	}
+
+	from = scale.Spec.Replicas
+	to = from + by
+	if max > 0 && to > max {
+		to = max
+	}
+	if to <= from {
+		return from, from, nil
+	}
+
+	scale.Spec.Replicas = to
+	if _, err := deployments.UpdateScale(ctx, name, scale, metav1.UpdateOptions{}); err != nil {
+		return from, from, fmt.Errorf("failed to scale deployment: %w", err)
+	}
+	return from, to, nil
+}
+
+// DeploymentRollout is the progress of a deployment's rollout
+type DeploymentRollout struct {
+	Name      string `json:"name"`
+	Replicas  int32  `json:"replicas"`
+	Updated   int32  `json:"updated"`
+	Available int32  `json:"available"`
+	Done      bool   `json:"done"`
+	Failed    bool   `json:"failed"` // It exceeded its progress deadline
+	Message   string `json:"message,omitempty"`
+}
+
+// DeploymentImage returns a container of a deployment, its only container when
+// container is empty, and the container's image
+func (c *ClusterClient) DeploymentImage(ctx context.Context, namespace, name, container string) (string, string, error) {
+	deployment, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get deployment: %w", err)
+	}
+	containers := deployment.Spec.Template.Spec.Containers
+	if container == "" {
+		if len(containers) != 1 {
+			return "", "", fmt.Errorf("deployment %s has %d containers; name the one to update", name, len(containers))
+		}
+		return containers[0].Name, containers[0].Image, nil
+	}
+	for _, candidate := range containers {
+		if candidate.Name == container {
+			return candidate.Name, candidate.Image, nil
+		}
+	}
+	return "", "", fmt.Errorf("deployment %s has no container %s", name, container)
+}
+
+// SetDeploymentImage sets the image of a container of a deployment, like
+// kubectl set image, which rolls the deployment out
+func (c *ClusterClient) SetDeploymentImage(ctx context.Context, namespace, name, container, image string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []map[string]string{{"name": container, "image": image}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := c.clientset.AppsV1().Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to set deployment image: %w", err)
+	}
+	return nil
+}
+
+// DeploymentRolloutStatus returns the progress of a deployment's rollout, as
+// kubectl rollout status reports it
+func (c *ClusterClient) DeploymentRolloutStatus(ctx context.Context, namespace, name string) (*DeploymentRollout, error) {
+	deployment, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+	rollout := deploymentRollout(deployment)
+	return &rollout, nil
+}
+
+// DeploymentRolloutStatuses returns the progress of the rollouts of the
+// deployments selector matches
+func (c *ClusterClient) DeploymentRolloutStatuses(ctx context.Context, namespace, selector string) ([]DeploymentRollout, error) {
+	deployments, err := c.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	rollouts := make([]DeploymentRollout, 0, len(deployments.Items))
+	for i := range deployments.Items {
+		rollouts = append(rollouts, deploymentRollout(&deployments.Items[i]))
+	}
+	return rollouts, nil
+}
+
+func deploymentRollout(deployment *appsv1.Deployment) DeploymentRollout {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	rollout := DeploymentRollout{
+		Name:      deployment.Name,
+		Replicas:  replicas,
+		Updated:   status.UpdatedReplicas,
+		Available: status.AvailableReplicas,
+	}
+
+	if deployment.Generation > status.ObservedGeneration {
+		rollout.Message = "Waiting for the rollout to start"
+		return rollout
+	}
+	for _, condition := range status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			rollout.Failed = true
+			rollout.Message = condition.Message
+			return rollout
+		}
+	}
+	switch {
+	case status.UpdatedReplicas < replicas:
+		rollout.Message = fmt.Sprintf("%d of %d new replicas updated", status.UpdatedReplicas, replicas)
+	case status.Replicas > status.UpdatedReplicas:
+		rollout.Message = fmt.Sprintf("%d old replicas pending termination", status.Replicas-status.UpdatedReplicas)
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		rollout.Message = fmt.Sprintf("%d of %d updated replicas available", status.AvailableReplicas, status.UpdatedReplicas)
+	default:
+		rollout.Done = true
+		rollout.Message = "Rolled out"
+	}
+	return rollout
+}
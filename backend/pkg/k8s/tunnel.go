@@ -0,0 +1,438 @@
+// Package k8s provides the reverse tunnel used to reach clusters through the in-cluster connector
+package k8s
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TunnelProtocol is the Upgrade protocol the connector asks for when it dials the gateway
+const TunnelProtocol = "myops-cluster-tunnel/1"
+
+// tunnelHostSuffix marks the API endpoints that are served through a tunnel; the
+// label before it is the cluster ID
+const tunnelHostSuffix = ".tunnel.myops.internal"
+
+const (
+	frameOpen  byte = 1 // gateway opens a stream
+	frameData  byte = 2
+	frameClose byte = 3 // either side closes a stream
+	framePing  byte = 4
+	framePong  byte = 5
+
+	frameHeaderSize = 9 // type, stream ID, payload length
+	maxFramePayload = 32 * 1024
+	// maxStreamBuffer is how much unread data a stream holds before it is reset
+	maxStreamBuffer = 8 << 20
+)
+
+// ErrTunnelClosed is returned when the tunnel's connection has gone away
+var ErrTunnelClosed = errors.New("cluster tunnel closed")
+
+// TunnelSession multiplexes streams over the single connection the connector
+// dialed out on. The gateway opens a stream per connection to the cluster's API
+// server; the connector accepts them, so a session is also a net.Listener.
+type TunnelSession struct {
+	conn io.ReadWriteCloser
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	streams map[uint32]*tunnelStream
+	nextID  uint32
+	accept  chan *tunnelStream
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+
+	lastSeen atomic.Int64 // unix nanoseconds of the last frame received
+}
+
+// NewTunnelSession starts multiplexing streams over conn
+func NewTunnelSession(conn io.ReadWriteCloser) *TunnelSession {
+	s := &TunnelSession{
+		conn:    conn,
+		streams: make(map[uint32]*tunnelStream),
+		accept:  make(chan *tunnelStream, 16),
+		done:    make(chan struct{}),
+	}
+	s.lastSeen.Store(time.Now().UnixNano())
+	go s.readLoop()
+	return s
+}
+
+// Open opens a stream to the other side
+func (s *TunnelSession) Open() (net.Conn, error) {
+	s.mu.Lock()
+	if s.isClosed() {
+		s.mu.Unlock()
+		return nil, ErrTunnelClosed
+	}
+	s.nextID++
+	stream := newTunnelStream(s, s.nextID)
+	s.streams[stream.id] = stream
+	s.mu.Unlock()
+
+	if err := s.writeFrame(frameOpen, stream.id, nil); err != nil {
+		s.removeStream(stream.id)
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Accept waits for the other side to open a stream
+func (s *TunnelSession) Accept() (net.Conn, error) {
+	select {
+	case stream := <-s.accept:
+		return stream, nil
+	case <-s.done:
+		return nil, ErrTunnelClosed
+	}
+}
+
+// Addr returns a placeholder address, for net.Listener
+func (s *TunnelSession) Addr() net.Addr {
+	return tunnelAddr{}
+}
+
+// Close closes the connection and every stream on it
+func (s *TunnelSession) Close() error {
+	s.close(ErrTunnelClosed)
+	return nil
+}
+
+// Done is closed when the session ends
+func (s *TunnelSession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the session ended
+func (s *TunnelSession) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Streams returns the number of open streams
+func (s *TunnelSession) Streams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// LastSeen returns when a frame was last received
+func (s *TunnelSession) LastSeen() time.Time {
+	return time.Unix(0, s.lastSeen.Load())
+}
+
+// KeepAlive pings the other side every interval and closes the session when
+// nothing has been received for three intervals. It returns when the session ends.
+func (s *TunnelSession) KeepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if time.Since(s.LastSeen()) > 3*interval {
+				s.close(fmt.Errorf("%w: no keepalive for %s", ErrTunnelClosed, 3*interval))
+				return
+			}
+			s.writeFrame(framePing, 0, nil)
+		}
+	}
+}
+
+func (s *TunnelSession) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *TunnelSession) close(err error) {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		streams := s.streams
+		s.streams = make(map[uint32]*tunnelStream)
+		close(s.done)
+		s.mu.Unlock()
+
+		s.conn.Close()
+		for _, stream := range streams {
+			stream.remoteClose()
+		}
+	})
+}
+
+func (s *TunnelSession) removeStream(id uint32) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
+
+func (s *TunnelSession) writeFrame(kind byte, id uint32, payload []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.isClosed() {
+		return ErrTunnelClosed
+	}
+	var header [frameHeaderSize]byte
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:5], id)
+	binary.BigEndian.PutUint32(header[5:9], uint32(len(payload)))
+	if _, err := s.conn.Write(header[:]); err != nil {
+		s.close(fmt.Errorf("%w: %v", ErrTunnelClosed, err))
+		return ErrTunnelClosed
+	}
+	if len(payload) > 0 {
+		if _, err := s.conn.Write(payload); err != nil {
+			s.close(fmt.Errorf("%w: %v", ErrTunnelClosed, err))
+			return ErrTunnelClosed
+		}
+	}
+	return nil
+}
+
+func (s *TunnelSession) readLoop() {
+	var header [frameHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(s.conn, header[:]); err != nil {
+			s.close(fmt.Errorf("%w: %v", ErrTunnelClosed, err))
+			return
+		}
+		kind := header[0]
+		id := binary.BigEndian.Uint32(header[1:5])
+		size := binary.BigEndian.Uint32(header[5:9])
+		if size > maxFramePayload {
+			s.close(fmt.Errorf("%w: frame of %d bytes exceeds the limit", ErrTunnelClosed, size))
+			return
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(s.conn, payload); err != nil {
+			s.close(fmt.Errorf("%w: %v", ErrTunnelClosed, err))
+			return
+		}
+		s.lastSeen.Store(time.Now().UnixNano())
+
+		switch kind {
+		case framePing:
+			s.writeFrame(framePong, 0, nil)
+		case framePong:
+		case frameOpen:
+			s.mu.Lock()
+			stream := newTunnelStream(s, id)
+			s.streams[id] = stream
+			s.mu.Unlock()
+			select {
+			case s.accept <- stream:
+			case <-s.done:
+				return
+			}
+		case frameData:
+			s.mu.Lock()
+			stream := s.streams[id]
+			s.mu.Unlock()
+			if stream != nil && !stream.receive(payload) {
+				// The reader fell too far behind; reset the stream rather than buffer without bound
+				s.removeStream(id)
+				stream.remoteClose()
+				s.writeFrame(frameClose, id, nil)
+			}
+		case frameClose:
+			s.mu.Lock()
+			stream := s.streams[id]
+			delete(s.streams, id)
+			s.mu.Unlock()
+			if stream != nil {
+				stream.remoteClose()
+			}
+		}
+	}
+}
+
+// tunnelStream is one connection carried by a session. Deadlines are not
+// supported; the HTTP clients and servers on either end rely on contexts instead.
+type tunnelStream struct {
+	session *TunnelSession
+	id      uint32
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	buf          []byte
+	remoteClosed bool
+	closed       bool
+}
+
+func newTunnelStream(s *TunnelSession, id uint32) *tunnelStream {
+	stream := &tunnelStream{session: s, id: id}
+	stream.cond = sync.NewCond(&stream.mu)
+	return stream
+}
+
+// receive buffers data from the other side, reporting false when the buffer is full
+func (c *tunnelStream) receive(data []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.remoteClosed {
+		return true
+	}
+	if len(c.buf)+len(data) > maxStreamBuffer {
+		return false
+	}
+	c.buf = append(c.buf, data...)
+	c.cond.Broadcast()
+	return true
+}
+
+func (c *tunnelStream) remoteClose() {
+	c.mu.Lock()
+	c.remoteClosed = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+func (c *tunnelStream) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.buf) == 0 && !c.remoteClosed && !c.closed {
+		c.cond.Wait()
+	}
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	if len(c.buf) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	if len(c.buf) == 0 {
+		c.buf = nil
+	}
+	return n, nil
+}
+
+func (c *tunnelStream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		c.mu.Lock()
+		closed, remoteClosed := c.closed, c.remoteClosed
+		c.mu.Unlock()
+		if closed {
+			return written, net.ErrClosed
+		}
+		if remoteClosed {
+			return written, io.ErrClosedPipe
+		}
+		n := min(len(p), maxFramePayload)
+		if err := c.session.writeFrame(frameData, c.id, p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (c *tunnelStream) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	remoteClosed := c.remoteClosed
+	c.buf = nil
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	c.session.removeStream(c.id)
+	if !remoteClosed {
+		c.session.writeFrame(frameClose, c.id, nil)
+	}
+	return nil
+}
+
+func (c *tunnelStream) LocalAddr() net.Addr                { return tunnelAddr{} }
+func (c *tunnelStream) RemoteAddr() net.Addr               { return tunnelAddr{} }
+func (c *tunnelStream) SetDeadline(t time.Time) error      { return nil }
+func (c *tunnelStream) SetReadDeadline(t time.Time) error  { return nil }
+func (c *tunnelStream) SetWriteDeadline(t time.Time) error { return nil }
+
+// tunnelAddr is the address of tunnel streams and sessions
+type tunnelAddr struct{}
+
+func (tunnelAddr) Network() string { return "tunnel" }
+func (tunnelAddr) String() string  { return "cluster-tunnel" }
+
+// ============== Registry ==============
+
+// tunnels holds the connected sessions by cluster ID
+var tunnels = struct {
+	sync.RWMutex
+	sessions map[string]*TunnelSession
+}{sessions: make(map[string]*TunnelSession)}
+
+// TunnelEndpoint returns the API endpoint that routes a cluster's traffic through
+// its connector. Kubeconfigs of connector clusters point at it.
+func TunnelEndpoint(clusterID string) string {
+	return "http://" + clusterID + tunnelHostSuffix
+}
+
+// RegisterTunnel makes a session the route to a cluster, closing the one it replaces
+func RegisterTunnel(clusterID string, session *TunnelSession) {
+	tunnels.Lock()
+	previous := tunnels.sessions[clusterID]
+	tunnels.sessions[clusterID] = session
+	tunnels.Unlock()
+	if previous != nil && previous != session {
+		previous.Close()
+	}
+}
+
+// UnregisterTunnel removes a session unless it has already been replaced
+func UnregisterTunnel(clusterID string, session *TunnelSession) {
+	tunnels.Lock()
+	if tunnels.sessions[clusterID] == session {
+		delete(tunnels.sessions, clusterID)
+	}
+	tunnels.Unlock()
+}
+
+// Tunnel returns the connected session of a cluster, or nil
+func Tunnel(clusterID string) *TunnelSession {
+	tunnels.RLock()
+	defer tunnels.RUnlock()
+	return tunnels.sessions[clusterID]
+}
+
+// tunnelDial returns a dialer for API endpoints served through a tunnel. The
+// session is looked up on each dial so clients survive connector reconnects.
+func tunnelDial(endpoint string) (func(ctx context.Context, network, addr string) (net.Conn, error), bool) {
+	u, err := url.Parse(endpoint)
+	if err != nil || !strings.HasSuffix(u.Hostname(), tunnelHostSuffix) {
+		return nil, false
+	}
+	clusterID := strings.TrimSuffix(u.Hostname(), tunnelHostSuffix)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		session := Tunnel(clusterID)
+		if session == nil {
+			return nil, fmt.Errorf("cluster connector for %s is not connected", clusterID)
+		}
+		return session.Open()
+	}, true
+}
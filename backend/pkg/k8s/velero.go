@@ -0,0 +1,619 @@
+// Package k8s provides Velero backups, restores and schedules of cluster resources
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// VeleroAPIVersion is the API group version of Velero's resources
+const VeleroAPIVersion = "velero.io/v1"
+
+var (
+	// ErrVeleroNotInstalled is returned when the cluster does not serve Velero's API
+	ErrVeleroNotInstalled = errors.New("velero is not installed in the cluster")
+	// ErrVeleroBackupIncomplete is returned when restoring a backup that has not completed
+	ErrVeleroBackupIncomplete = errors.New("only completed backups can be restored")
+	// ErrVeleroNotFound is returned when a backup, restore or schedule does not exist
+	ErrVeleroNotFound = errors.New("not found")
+	// ErrVeleroExists is returned when creating a schedule whose name is taken
+	ErrVeleroExists = errors.New("already exists")
+)
+
+var (
+	veleroBackups          = schema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: "backups"}
+	veleroRestores         = schema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: "restores"}
+	veleroSchedules        = schema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: "schedules"}
+	veleroStorageLocations = schema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: "backupstoragelocations"}
+	veleroDeleteRequests   = schema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: "deletebackuprequests"}
+)
+
+// VeleroStorageLocation is a BackupStorageLocation and whether Velero can reach it
+type VeleroStorageLocation struct {
+	Name          string     `json:"name"`
+	Provider      string     `json:"provider"`
+	Bucket        string     `json:"bucket"`
+	Prefix        string     `json:"prefix,omitempty"`
+	Default       bool       `json:"default"`
+	Phase         string     `json:"phase"` // Available or Unavailable
+	LastValidated *time.Time `json:"lastValidated,omitempty"`
+}
+
+// VeleroStatus is whether Velero runs in a cluster and where it stores backups
+type VeleroStatus struct {
+	Installed        bool                    `json:"installed"` // The cluster serves velero.io/v1
+	Namespace        string                  `json:"namespace"`
+	Ready            bool                    `json:"ready"` // The velero deployment has an available replica
+	Version          string                  `json:"version,omitempty"`
+	StorageLocations []VeleroStorageLocation `json:"storageLocations"`
+	Message          string                  `json:"message,omitempty"`
+}
+
+// VeleroBackupSpec selects what a backup includes
+type VeleroBackupSpec struct {
+	IncludedNamespaces []string          `json:"includedNamespaces,omitempty"` // All namespaces when empty
+	ExcludedNamespaces []string          `json:"excludedNamespaces,omitempty"`
+	LabelSelector      map[string]string `json:"labelSelector,omitempty"`
+	SnapshotVolumes    *bool             `json:"snapshotVolumes,omitempty"`
+	StorageLocation    string            `json:"storageLocation,omitempty"` // The default location when empty
+	TTL                string            `json:"ttl,omitempty"`             // How long the backup is kept, such as 720h
+}
+
+// VeleroBackup summarizes a Velero Backup
+type VeleroBackup struct {
+	Name       string           `json:"name"`
+	Spec       VeleroBackupSpec `json:"spec"`
+	Schedule   string           `json:"schedule,omitempty"` // Schedule that created the backup
+	Phase      string           `json:"phase"`
+	Errors     int              `json:"errors"`
+	Warnings   int              `json:"warnings"`
+	Items      int              `json:"items"`
+	TotalItems int              `json:"totalItems"`
+	StartedAt  *time.Time       `json:"startedAt,omitempty"`
+	Completed  *time.Time       `json:"completedAt,omitempty"`
+	Expiration *time.Time       `json:"expiration,omitempty"`
+	CreatedAt  time.Time        `json:"createdAt"`
+}
+
+// VeleroRestoreSpec selects what a restore brings back from a backup
+type VeleroRestoreSpec struct {
+	BackupName         string            `json:"backupName"`
+	IncludedNamespaces []string          `json:"includedNamespaces,omitempty"`
+	ExcludedNamespaces []string          `json:"excludedNamespaces,omitempty"`
+	NamespaceMapping   map[string]string `json:"namespaceMapping,omitempty"` // Restore namespaces under other names
+	RestorePVs         *bool             `json:"restorePVs,omitempty"`
+}
+
+// VeleroRestore summarizes a Velero Restore
+type VeleroRestore struct {
+	Name      string            `json:"name"`
+	Spec      VeleroRestoreSpec `json:"spec"`
+	Phase     string            `json:"phase"`
+	Errors    int               `json:"errors"`
+	Warnings  int               `json:"warnings"`
+	StartedAt *time.Time        `json:"startedAt,omitempty"`
+	Completed *time.Time        `json:"completedAt,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// VeleroScheduleSpec is a cron schedule of backups
+type VeleroScheduleSpec struct {
+	Schedule string           `json:"schedule"` // Cron expression
+	Template VeleroBackupSpec `json:"template"`
+	Paused   bool             `json:"paused,omitempty"`
+}
+
+// VeleroSchedule summarizes a Velero Schedule
+type VeleroSchedule struct {
+	Name       string             `json:"name"`
+	Spec       VeleroScheduleSpec `json:"spec"`
+	Phase      string             `json:"phase"`
+	LastBackup *time.Time         `json:"lastBackup,omitempty"`
+	CreatedAt  time.Time          `json:"createdAt"`
+}
+
+// veleroObject is the part of Velero's Backup, Restore and Schedule objects read here
+type veleroObject struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		IncludedNamespaces []string              `json:"includedNamespaces,omitempty"`
+		ExcludedNamespaces []string              `json:"excludedNamespaces,omitempty"`
+		LabelSelector      *metav1.LabelSelector `json:"labelSelector,omitempty"`
+		SnapshotVolumes    *bool                 `json:"snapshotVolumes,omitempty"`
+		StorageLocation    string                `json:"storageLocation,omitempty"`
+		TTL                string                `json:"ttl,omitempty"`
+		BackupName         string                `json:"backupName,omitempty"`
+		NamespaceMapping   map[string]string     `json:"namespaceMapping,omitempty"`
+		RestorePVs         *bool                 `json:"restorePVs,omitempty"`
+		Schedule           string                `json:"schedule,omitempty"`
+		Paused             bool                  `json:"paused,omitempty"`
+		Template           struct {
+			IncludedNamespaces []string              `json:"includedNamespaces,omitempty"`
+			ExcludedNamespaces []string              `json:"excludedNamespaces,omitempty"`
+			LabelSelector      *metav1.LabelSelector `json:"labelSelector,omitempty"`
+			SnapshotVolumes    *bool                 `json:"snapshotVolumes,omitempty"`
+			StorageLocation    string                `json:"storageLocation,omitempty"`
+			TTL                string                `json:"ttl,omitempty"`
+		} `json:"template"`
+		Provider      string `json:"provider,omitempty"`
+		Default       bool   `json:"default,omitempty"`
+		ObjectStorage struct {
+			Bucket string `json:"bucket"`
+			Prefix string `json:"prefix,omitempty"`
+		} `json:"objectStorage"`
+	} `json:"spec"`
+	Status struct {
+		Phase               string       `json:"phase,omitempty"`
+		Errors              int          `json:"errors,omitempty"`
+		Warnings            int          `json:"warnings,omitempty"`
+		StartTimestamp      *metav1.Time `json:"startTimestamp,omitempty"`
+		CompletionTimestamp *metav1.Time `json:"completionTimestamp,omitempty"`
+		Expiration          *metav1.Time `json:"expiration,omitempty"`
+		LastBackup          *metav1.Time `json:"lastBackup,omitempty"`
+		LastValidationTime  *metav1.Time `json:"lastValidationTime,omitempty"`
+		Progress            struct {
+			ItemsBackedUp int `json:"itemsBackedUp,omitempty"`
+			TotalItems    int `json:"totalItems,omitempty"`
+		} `json:"progress"`
+	} `json:"status"`
+}
+
+func (c *ClusterClient) veleroClient() (dynamic.Interface, error) {
+	client, err := dynamic.NewForConfig(c.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	return client, nil
+}
+
+// veleroInstalled reports whether the cluster serves Velero's API
+func (c *ClusterClient) veleroInstalled() (bool, error) {
+	if _, err := c.clientset.Discovery().ServerResourcesForGroupVersion(VeleroAPIVersion); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to discover velero API: %w", err)
+	}
+	return true, nil
+}
+
+// GetVeleroStatus reports whether Velero is installed and running in namespace,
+// and the state of its storage locations
+func (c *ClusterClient) GetVeleroStatus(ctx context.Context, namespace string) (*VeleroStatus, error) {
+	status := &VeleroStatus{Namespace: namespace, StorageLocations: []VeleroStorageLocation{}}
+	installed, err := c.veleroInstalled()
+	if err != nil {
+		return nil, err
+	}
+	if !installed {
+		status.Message = "The cluster does not serve " + VeleroAPIVersion
+		return status, nil
+	}
+	status.Installed = true
+
+	deployment, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, "velero", metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		status.Message = "No velero deployment in namespace " + namespace
+	case err != nil:
+		return nil, fmt.Errorf("failed to get velero deployment: %w", err)
+	default:
+		status.Ready = deployment.Status.AvailableReplicas > 0
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			if container.Name == "velero" {
+				if i := strings.LastIndex(container.Image, ":"); i > 0 && !strings.Contains(container.Image[i:], "/") {
+					status.Version = container.Image[i+1:]
+				}
+			}
+		}
+		if !status.Ready {
+			status.Message = "The velero deployment has no available replica"
+		}
+	}
+
+	client, err := c.veleroClient()
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.Resource(veleroStorageLocations).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backup storage locations: %w", err)
+	}
+	for i := range list.Items {
+		obj, err := decodeVeleroObject(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		status.StorageLocations = append(status.StorageLocations, VeleroStorageLocation{
+			Name:          obj.Name,
+			Provider:      obj.Spec.Provider,
+			Bucket:        obj.Spec.ObjectStorage.Bucket,
+			Prefix:        obj.Spec.ObjectStorage.Prefix,
+			Default:       obj.Spec.Default,
+			Phase:         obj.Status.Phase,
+			LastValidated: getTimePtr(obj.Status.LastValidationTime),
+		})
+	}
+	return status, nil
+}
+
+// ListVeleroBackups lists the backups in Velero's namespace, newest first
+func (c *ClusterClient) ListVeleroBackups(ctx context.Context, namespace string) ([]VeleroBackup, error) {
+	objects, err := c.listVelero(ctx, veleroBackups, namespace)
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]VeleroBackup, 0, len(objects))
+	for _, obj := range objects {
+		backups = append(backups, veleroBackup(obj))
+	}
+	return backups, nil
+}
+
+// GetVeleroBackup gets a backup
+func (c *ClusterClient) GetVeleroBackup(ctx context.Context, namespace, name string) (*VeleroBackup, error) {
+	obj, err := c.getVelero(ctx, veleroBackups, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	backup := veleroBackup(obj)
+	return &backup, nil
+}
+
+// CreateVeleroBackup starts a backup; its name is generated from prefix
+func (c *ClusterClient) CreateVeleroBackup(ctx context.Context, namespace, prefix string, spec *VeleroBackupSpec) (*VeleroBackup, error) {
+	obj := newVeleroObject("Backup", namespace, prefix)
+	obj.Object["spec"] = veleroBackupSpec(spec)
+	created, err := c.createVelero(ctx, veleroBackups, namespace, obj)
+	if err != nil {
+		return nil, err
+	}
+	backup := veleroBackup(created)
+	return &backup, nil
+}
+
+// DeleteVeleroBackup asks Velero to delete a backup with its data in object
+// storage. Deleting the Backup object alone would leave the data behind.
+func (c *ClusterClient) DeleteVeleroBackup(ctx context.Context, namespace, name string) error {
+	if _, err := c.getVelero(ctx, veleroBackups, namespace, name); err != nil {
+		return err
+	}
+	obj := newVeleroObject("DeleteBackupRequest", namespace, name+"-")
+	obj.Object["spec"] = map[string]interface{}{"backupName": name}
+	_, err := c.createVelero(ctx, veleroDeleteRequests, namespace, obj)
+	return err
+}
+
+// ListVeleroRestores lists the restores in Velero's namespace, newest first
+func (c *ClusterClient) ListVeleroRestores(ctx context.Context, namespace string) ([]VeleroRestore, error) {
+	objects, err := c.listVelero(ctx, veleroRestores, namespace)
+	if err != nil {
+		return nil, err
+	}
+	restores := make([]VeleroRestore, 0, len(objects))
+	for _, obj := range objects {
+		restores = append(restores, veleroRestore(obj))
+	}
+	return restores, nil
+}
+
+// CreateVeleroRestore starts restoring from a completed backup
+func (c *ClusterClient) CreateVeleroRestore(ctx context.Context, namespace string, spec *VeleroRestoreSpec) (*VeleroRestore, error) {
+	backup, err := c.GetVeleroBackup(ctx, namespace, spec.BackupName)
+	if err != nil {
+		return nil, err
+	}
+	if backup.Phase != "Completed" && backup.Phase != "PartiallyFailed" {
+		return nil, fmt.Errorf("%w: backup %s is %s", ErrVeleroBackupIncomplete, backup.Name, backup.Phase)
+	}
+
+	obj := newVeleroObject("Restore", namespace, spec.BackupName+"-")
+	restoreSpec := map[string]interface{}{"backupName": spec.BackupName}
+	setStrings(restoreSpec, "includedNamespaces", spec.IncludedNamespaces)
+	setStrings(restoreSpec, "excludedNamespaces", spec.ExcludedNamespaces)
+	if len(spec.NamespaceMapping) > 0 {
+		mapping := make(map[string]interface{}, len(spec.NamespaceMapping))
+		for from, to := range spec.NamespaceMapping {
+			mapping[from] = to
+		}
+		restoreSpec["namespaceMapping"] = mapping
+	}
+	if spec.RestorePVs != nil {
+		restoreSpec["restorePVs"] = *spec.RestorePVs
+	}
+	obj.Object["spec"] = restoreSpec
+
+	created, err := c.createVelero(ctx, veleroRestores, namespace, obj)
+	if err != nil {
+		return nil, err
+	}
+	restore := veleroRestore(created)
+	return &restore, nil
+}
+
+// ListVeleroSchedules lists the backup schedules in Velero's namespace
+func (c *ClusterClient) ListVeleroSchedules(ctx context.Context, namespace string) ([]VeleroSchedule, error) {
+	objects, err := c.listVelero(ctx, veleroSchedules, namespace)
+	if err != nil {
+		return nil, err
+	}
+	schedules := make([]VeleroSchedule, 0, len(objects))
+	for _, obj := range objects {
+		schedules = append(schedules, veleroSchedule(obj))
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].Name < schedules[j].Name })
+	return schedules, nil
+}
+
+// CreateVeleroSchedule adds a schedule of recurring backups
+func (c *ClusterClient) CreateVeleroSchedule(ctx context.Context, namespace, name string, spec *VeleroScheduleSpec) (*VeleroSchedule, error) {
+	obj := newVeleroObject("Schedule", namespace, "")
+	obj.SetName(name)
+	obj.Object["spec"] = map[string]interface{}{
+		"schedule": spec.Schedule,
+		"template": veleroBackupSpec(&spec.Template),
+		"paused":   spec.Paused,
+	}
+	created, err := c.createVelero(ctx, veleroSchedules, namespace, obj)
+	if err != nil {
+		return nil, err
+	}
+	schedule := veleroSchedule(created)
+	return &schedule, nil
+}
+
+// UpdateVeleroSchedule replaces a schedule's cron expression, template and pause
+func (c *ClusterClient) UpdateVeleroSchedule(ctx context.Context, namespace, name string, spec *VeleroScheduleSpec) (*VeleroSchedule, error) {
+	client, err := c.veleroClient()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := client.Resource(veleroSchedules).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, veleroError(err, "schedule", name)
+	}
+	obj.Object["spec"] = map[string]interface{}{
+		"schedule": spec.Schedule,
+		"template": veleroBackupSpec(&spec.Template),
+		"paused":   spec.Paused,
+	}
+	updated, err := client.Resource(veleroSchedules).Namespace(namespace).Update(ctx, obj, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update schedule %s: %w", name, err)
+	}
+	decoded, err := decodeVeleroObject(updated)
+	if err != nil {
+		return nil, err
+	}
+	schedule := veleroSchedule(decoded)
+	return &schedule, nil
+}
+
+// DeleteVeleroSchedule removes a schedule. The backups it took are kept.
+func (c *ClusterClient) DeleteVeleroSchedule(ctx context.Context, namespace, name string) error {
+	client, err := c.veleroClient()
+	if err != nil {
+		return err
+	}
+	if err := client.Resource(veleroSchedules).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return veleroError(err, "schedule", name)
+	}
+	return nil
+}
+
+func (c *ClusterClient) listVelero(ctx context.Context, gvr schema.GroupVersionResource, namespace string) ([]*veleroObject, error) {
+	installed, err := c.veleroInstalled()
+	if err != nil {
+		return nil, err
+	}
+	if !installed {
+		return nil, ErrVeleroNotInstalled
+	}
+	client, err := c.veleroClient()
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+	}
+
+	objects := make([]*veleroObject, 0, len(list.Items))
+	for i := range list.Items {
+		obj, err := decodeVeleroObject(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].CreationTimestamp.After(objects[j].CreationTimestamp.Time)
+	})
+	return objects, nil
+}
+
+func (c *ClusterClient) getVelero(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) (*veleroObject, error) {
+	client, err := c.veleroClient()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := client.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, veleroError(err, strings.TrimSuffix(gvr.Resource, "s"), name)
+	}
+	return decodeVeleroObject(obj)
+}
+
+func (c *ClusterClient) createVelero(ctx context.Context, gvr schema.GroupVersionResource, namespace string, obj *unstructured.Unstructured) (*veleroObject, error) {
+	installed, err := c.veleroInstalled()
+	if err != nil {
+		return nil, err
+	}
+	if !installed {
+		return nil, ErrVeleroNotInstalled
+	}
+	client, err := c.veleroClient()
+	if err != nil {
+		return nil, err
+	}
+	created, err := client.Resource(gvr).Namespace(namespace).Create(ctx, obj, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil, fmt.Errorf("%s %s %w", strings.TrimSuffix(gvr.Resource, "s"), obj.GetName(), ErrVeleroExists)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", strings.TrimSuffix(gvr.Resource, "s"), err)
+	}
+	return decodeVeleroObject(created)
+}
+
+// veleroError describes a failed get or delete
+func veleroError(err error, kind, name string) error {
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("%s %s %w", kind, name, ErrVeleroNotFound)
+	}
+	return fmt.Errorf("failed to get %s %s: %w", kind, name, err)
+}
+
+func newVeleroObject(kind, namespace, generateName string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetAPIVersion(VeleroAPIVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	if generateName != "" {
+		obj.SetGenerateName(generateName)
+	}
+	obj.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "myops"})
+	return obj
+}
+
+func decodeVeleroObject(obj *unstructured.Unstructured) (*veleroObject, error) {
+	var decoded veleroObject
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode %s %s: %w", obj.GetKind(), obj.GetName(), err)
+	}
+	return &decoded, nil
+}
+
+func veleroBackupSpec(spec *VeleroBackupSpec) map[string]interface{} {
+	out := map[string]interface{}{}
+	setStrings(out, "includedNamespaces", spec.IncludedNamespaces)
+	setStrings(out, "excludedNamespaces", spec.ExcludedNamespaces)
+	if len(spec.LabelSelector) > 0 {
+		labels := make(map[string]interface{}, len(spec.LabelSelector))
+		for k, v := range spec.LabelSelector {
+			labels[k] = v
+		}
+		out["labelSelector"] = map[string]interface{}{"matchLabels": labels}
+	}
+	if spec.SnapshotVolumes != nil {
+		out["snapshotVolumes"] = *spec.SnapshotVolumes
+	}
+	if spec.StorageLocation != "" {
+		out["storageLocation"] = spec.StorageLocation
+	}
+	if spec.TTL != "" {
+		out["ttl"] = spec.TTL
+	}
+	return out
+}
+
+func setStrings(out map[string]interface{}, key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	list := make([]interface{}, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+	out[key] = list
+}
+
+func veleroBackup(obj *veleroObject) VeleroBackup {
+	spec := obj.Spec
+	backup := VeleroBackup{
+		Name: obj.Name,
+		Spec: VeleroBackupSpec{
+			IncludedNamespaces: spec.IncludedNamespaces,
+			ExcludedNamespaces: spec.ExcludedNamespaces,
+			SnapshotVolumes:    spec.SnapshotVolumes,
+			StorageLocation:    spec.StorageLocation,
+			TTL:                spec.TTL,
+		},
+		Schedule:   obj.Labels["velero.io/schedule-name"],
+		Phase:      obj.Status.Phase,
+		Errors:     obj.Status.Errors,
+		Warnings:   obj.Status.Warnings,
+		Items:      obj.Status.Progress.ItemsBackedUp,
+		TotalItems: obj.Status.Progress.TotalItems,
+		StartedAt:  getTimePtr(obj.Status.StartTimestamp),
+		Completed:  getTimePtr(obj.Status.CompletionTimestamp),
+		Expiration: getTimePtr(obj.Status.Expiration),
+		CreatedAt:  obj.CreationTimestamp.Time,
+	}
+	if spec.LabelSelector != nil {
+		backup.Spec.LabelSelector = spec.LabelSelector.MatchLabels
+	}
+	if backup.Phase == "" {
+		backup.Phase = "New"
+	}
+	return backup
+}
+
+func veleroRestore(obj *veleroObject) VeleroRestore {
+	restore := VeleroRestore{
+		Name: obj.Name,
+		Spec: VeleroRestoreSpec{
+			BackupName:         obj.Spec.BackupName,
+			IncludedNamespaces: obj.Spec.IncludedNamespaces,
+			ExcludedNamespaces: obj.Spec.ExcludedNamespaces,
+			NamespaceMapping:   obj.Spec.NamespaceMapping,
+			RestorePVs:         obj.Spec.RestorePVs,
+		},
+		Phase:     obj.Status.Phase,
+		Errors:    obj.Status.Errors,
+		Warnings:  obj.Status.Warnings,
+		StartedAt: getTimePtr(obj.Status.StartTimestamp),
+		Completed: getTimePtr(obj.Status.CompletionTimestamp),
+		CreatedAt: obj.CreationTimestamp.Time,
+	}
+	if restore.Phase == "" {
+		restore.Phase = "New"
+	}
+	return restore
+}
+
+func veleroSchedule(obj *veleroObject) VeleroSchedule {
+	template := obj.Spec.Template
+	schedule := VeleroSchedule{
+		Name: obj.Name,
+		Spec: VeleroScheduleSpec{
+			Schedule: obj.Spec.Schedule,
+			Template: VeleroBackupSpec{
+				IncludedNamespaces: template.IncludedNamespaces,
+				ExcludedNamespaces: template.ExcludedNamespaces,
+				SnapshotVolumes:    template.SnapshotVolumes,
+				StorageLocation:    template.StorageLocation,
+				TTL:                template.TTL,
+			},
+			Paused: obj.Spec.Paused,
+		},
+		Phase:      obj.Status.Phase,
+		LastBackup: getTimePtr(obj.Status.LastBackup),
+		CreatedAt:  obj.CreationTimestamp.Time,
+	}
+	if template.LabelSelector != nil {
+		schedule.Spec.Template.LabelSelector = template.LabelSelector.MatchLabels
+	}
+	return schedule
+}
@@ -0,0 +1,297 @@
+// Package k8s provides informer-backed watches of the pods, deployments and
+// events of a namespace
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// WatchKind is a kind of object a namespace informer follows
+type WatchKind string
+
+const (
+	WatchPods        WatchKind = "pods"
+	WatchDeployments WatchKind = "deployments"
+	WatchEvents      WatchKind = "events"
+)
+
+// WatchKinds are the kinds a namespace informer can follow
+var WatchKinds = []WatchKind{WatchPods, WatchDeployments, WatchEvents}
+
+// WatchDeltaType is how a watched object changed
+type WatchDeltaType string
+
+const (
+	WatchAdded    WatchDeltaType = "added"
+	WatchModified WatchDeltaType = "modified"
+	WatchDeleted  WatchDeltaType = "deleted"
+	// WatchBookmark marks the resource version a kind was listed at when its
+	// informer synced. It carries no object.
+	WatchBookmark WatchDeltaType = "bookmark"
+)
+
+// WatchDelta is a change to a watched object. Object is a PodInfo,
+// DeploymentInfo or EventSummary.
+type WatchDelta struct {
+	Kind            WatchKind         `json:"kind"`
+	Type            WatchDeltaType    `json:"type"`
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	ResourceVersion string            `json:"resourceVersion"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Object          interface{}       `json:"object,omitempty"`
+
+	involved string // Name of the object an event is about
+}
+
+// WatchFilter selects the deltas of a watch by the labels and name of their
+// objects
+type WatchFilter struct {
+	selector labels.Selector
+	name     string
+}
+
+// NewWatchFilter parses a label selector into a filter. When name is set,
+// only objects of that name pass; events pass on the name of the object they
+// are about as well as their own.
+func NewWatchFilter(labelSelector, name string) (*WatchFilter, error) {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector: %w", err)
+	}
+	return &WatchFilter{selector: selector, name: name}, nil
+}
+
+// Matches reports whether a delta passes the filter. A nil filter passes
+// every delta.
+func (f *WatchFilter) Matches(d *WatchDelta) bool {
+	if f == nil {
+		return true
+	}
+	if f.name != "" && d.Name != f.name && d.involved != f.name {
+		return false
+	}
+	return f.selector.Matches(labels.Set(d.Labels))
+}
+
+// EventSummary summarizes an event of a watched namespace
+type EventSummary struct {
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Kind      string    `json:"kind"` // Kind of the object the event is about
+	Object    string    `json:"object"`
+	Count     int32     `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// NamespaceInformer follows the objects of one namespace through shared
+// informers, reporting each change after the initial list to a handler.
+// Kinds are only listed and watched once asked for.
+type NamespaceInformer struct {
+	namespace string
+	factory   informers.SharedInformerFactory
+	handle    func(WatchDelta)
+
+	mu        sync.Mutex
+	informers map[WatchKind]cache.SharedIndexInformer
+	stop      chan struct{}
+	stopped   bool
+}
+
+// NewNamespaceInformer creates an informer of namespace that reports changes
+// to handle. handle is called from the informers' goroutines, one kind at a
+// time in the order of the changes.
+func (c *ClusterClient) NewNamespaceInformer(namespace string, handle func(WatchDelta)) *NamespaceInformer {
+	return &NamespaceInformer{
+		namespace: namespace,
+		factory:   informers.NewSharedInformerFactoryWithOptions(c.clientset, 0, informers.WithNamespace(namespace)),
+		handle:    handle,
+		informers: map[WatchKind]cache.SharedIndexInformer{},
+		stop:      make(chan struct{}),
+	}
+}
+
+// Watch starts following kind unless the informer already does, and waits
+// for its cache to sync. It returns the bookmark of the initial list when the
+// kind was started by this call.
+func (i *NamespaceInformer) Watch(ctx context.Context, kind WatchKind) (*WatchDelta, error) {
+	i.mu.Lock()
+	if i.stopped {
+		i.mu.Unlock()
+		return nil, fmt.Errorf("informer of namespace %s is stopped", i.namespace)
+	}
+	informer, started := i.informers[kind]
+	if !started {
+		switch kind {
+		case WatchPods:
+			informer = i.factory.Core().V1().Pods().Informer()
+		case WatchDeployments:
+			informer = i.factory.Apps().V1().Deployments().Informer()
+		case WatchEvents:
+			informer = i.factory.Core().V1().Events().Informer()
+		default:
+			i.mu.Unlock()
+			return nil, fmt.Errorf("unsupported watch kind %q", kind)
+		}
+		if err := informer.SetTransform(stripManagedFields); err != nil {
+			i.mu.Unlock()
+			return nil, err
+		}
+		if _, err := informer.AddEventHandler(i.handler(kind)); err != nil {
+			i.mu.Unlock()
+			return nil, err
+		}
+		i.informers[kind] = informer
+		i.factory.Start(i.stop)
+	}
+	i.mu.Unlock()
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return nil, fmt.Errorf("failed to sync %s of namespace %s: %w", kind, i.namespace, ctx.Err())
+	}
+	if started {
+		return nil, nil
+	}
+	return &WatchDelta{
+		Kind:            kind,
+		Type:            WatchBookmark,
+		Namespace:       i.namespace,
+		ResourceVersion: informer.LastSyncResourceVersion(),
+	}, nil
+}
+
+// List returns the current objects of a followed kind as added deltas
+func (i *NamespaceInformer) List(kind WatchKind) []WatchDelta {
+	i.mu.Lock()
+	informer, ok := i.informers[kind]
+	i.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	objects := informer.GetStore().List()
+	deltas := make([]WatchDelta, 0, len(objects))
+	for _, obj := range objects {
+		if delta, ok := watchDelta(kind, WatchAdded, obj); ok {
+			deltas = append(deltas, delta)
+		}
+	}
+	return deltas
+}
+
+// Stop stops the informers
+func (i *NamespaceInformer) Stop() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.stopped {
+		i.stopped = true
+		close(i.stop)
+	}
+}
+
+func (i *NamespaceInformer) handler(kind WatchKind) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			if isInInitialList {
+				return
+			}
+			if delta, ok := watchDelta(kind, WatchAdded, obj); ok {
+				i.handle(delta)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// Relists replay every object; only report real changes
+			if oldMeta, err := meta.Accessor(oldObj); err == nil {
+				if newMeta, err := meta.Accessor(newObj); err == nil && oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+					return
+				}
+			}
+			if delta, ok := watchDelta(kind, WatchModified, newObj); ok {
+				i.handle(delta)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if delta, ok := watchDelta(kind, WatchDeleted, obj); ok {
+				i.handle(delta)
+			}
+		},
+	}
+}
+
+// watchDelta summarizes an object of an informer's store
+func watchDelta(kind WatchKind, deltaType WatchDeltaType, obj interface{}) (WatchDelta, bool) {
+	delta := WatchDelta{Kind: kind, Type: deltaType}
+	switch o := obj.(type) {
+	case *v1.Pod:
+		delta.Object = podInfo(o)
+	case *appsv1.Deployment:
+		delta.Object = deploymentInfo(o)
+	case *v1.Event:
+		delta.Object = eventSummary(o)
+		delta.involved = o.InvolvedObject.Name
+	default:
+		return delta, false
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return delta, false
+	}
+	delta.Name = accessor.GetName()
+	delta.Namespace = accessor.GetNamespace()
+	delta.ResourceVersion = accessor.GetResourceVersion()
+	delta.Labels = accessor.GetLabels()
+	return delta, true
+}
+
+func eventSummary(e *v1.Event) EventSummary {
+	lastSeen := e.LastTimestamp.Time
+	if lastSeen.IsZero() {
+		lastSeen = e.EventTime.Time
+	}
+	if lastSeen.IsZero() {
+		lastSeen = e.CreationTimestamp.Time
+	}
+	firstSeen := e.FirstTimestamp.Time
+	if firstSeen.IsZero() {
+		firstSeen = lastSeen
+	}
+	count := e.Count
+	if count == 0 && e.Series != nil {
+		count = e.Series.Count
+	}
+	return EventSummary{
+		Type:      e.Type,
+		Reason:    e.Reason,
+		Message:   e.Message,
+		Kind:      e.InvolvedObject.Kind,
+		Object:    e.InvolvedObject.Name,
+		Count:     count,
+		FirstSeen: firstSeen,
+		LastSeen:  lastSeen,
+	}
+}
+
+// stripManagedFields drops managed fields from objects before they are
+// cached, as watches never report them
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if accessor, err := meta.Accessor(obj); err == nil {
+		accessor.SetManagedFields(nil)
+	}
+	return obj, nil
+}
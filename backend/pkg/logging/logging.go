@@ -0,0 +1,112 @@
+// Package logging carries the correlation ID of a request through the calls
+// made on its behalf, so the logs of every service it reaches can be joined up
+package logging
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is the header correlation IDs are passed in, to and from
+// clients and to the services called downstream
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the correlation IDs accepted from clients
+const maxRequestIDLength = 64
+
+type contextKey struct{}
+
+// NewRequestID generates a correlation ID
+func NewRequestID() string {
+	return "req-" + uuid.NewString()
+}
+
+// ValidRequestID reports whether a correlation ID sent by a client can be
+// adopted: short, and only letters, digits, '-', '_', '.' and ':'
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// WithRequestID returns a context carrying a correlation ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// RequestID returns the correlation ID a context carries, or "" when it
+// carries none
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Transport sets the correlation ID of each request's context on its
+// RequestIDHeader before passing it to base, or http.DefaultTransport when
+// base is nil
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return requestIDTransport{base: base}
+}
+
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := RequestID(req.Context())
+	if id == "" || req.Header.Get(RequestIDHeader) != "" {
+		return t.base.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	req.Header.Set(RequestIDHeader, id)
+	return t.base.RoundTrip(req)
+}
+
+// errorRecorder is implemented by response writers that log or audit the
+// error a response reports
+type errorRecorder interface {
+	RecordError(code, message string)
+}
+
+// RecordError tells the response writers w wraps, down to the one the server
+// gave, which error the response reports
+func RecordError(w http.ResponseWriter, code, message string) {
+	for w != nil {
+		if recorder, ok := w.(errorRecorder); ok {
+			recorder.RecordError(code, message)
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// ResponseRequestID returns the correlation ID of the request a response is
+// written for, which the server set on the response's RequestIDHeader, or a
+// new one when it set none
+func ResponseRequestID(w http.ResponseWriter) string {
+	if id := w.Header().Get(RequestIDHeader); id != "" {
+		return id
+	}
+	return NewRequestID()
+}
@@ -0,0 +1,158 @@
+// Package model provides account lifecycle models: invitations, password resets and MFA
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserInvitation is an emailed invitation to create an account. Only a hash of the
+// invitation token is stored.
+type UserInvitation struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Email      string     `gorm:"type:varchar(255);not null;index" json:"email"`
+	Username   string     `gorm:"type:varchar(255)" json:"username,omitempty"` // Suggested username
+	RoleID     *uuid.UUID `gorm:"type:uuid" json:"roleId,omitempty"`           // Role given on acceptance
+	InvitedBy  uuid.UUID  `gorm:"type:uuid;not null" json:"invitedBy"`
+	TokenHash  string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expiresAt"`
+	AcceptedAt *time.Time `json:"acceptedAt,omitempty"`
+	UserID     *uuid.UUID `gorm:"type:uuid" json:"userId,omitempty"` // The account created on acceptance
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	Status     string     `gorm:"-" json:"status"`
+}
+
+// TableName specifies the table name for UserInvitation
+func (UserInvitation) TableName() string {
+	return "user_invitations"
+}
+
+// Invitation statuses
+const (
+	InvitationStatusPending  = "pending"
+	InvitationStatusAccepted = "accepted"
+	InvitationStatusExpired  = "expired"
+)
+
+// StatusAt returns the status of the invitation at now
+func (i *UserInvitation) StatusAt(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationStatusAccepted
+	case i.ExpiresAt.Before(now):
+		return InvitationStatusExpired
+	}
+	return InvitationStatusPending
+}
+
+// PasswordResetToken is a single-use token for resetting a local user's password
+type PasswordResetToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	TokenHash string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// TableName specifies the table name for PasswordResetToken
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
+
+// UserMFA is a user's TOTP enrollment. It only takes effect once Enabled is set by
+// verifying a first code.
+type UserMFA struct {
+	UserID    uuid.UUID  `gorm:"type:uuid;primary_key" json:"userId"`
+	Secret    string     `gorm:"type:varchar(64);not null" json:"-"` // Base32 TOTP secret
+	Enabled   bool       `gorm:"default:false" json:"enabled"`
+	EnabledAt *time.Time `json:"enabledAt,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// TableName specifies the table name for UserMFA
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// MFARecoveryCode is a single-use code that stands in for a TOTP code
+type MFARecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	CodeHash  string     `gorm:"type:varchar(64);not null" json:"-"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// TableName specifies the table name for MFARecoveryCode
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// MFAChallenge is a password login waiting for its second factor
+type MFAChallenge struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
+	TokenHash string    `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	Attempts  int       `gorm:"default:0" json:"attempts"`
+	ExpiresAt time.Time `gorm:"not null" json:"expiresAt"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// TableName specifies the table name for MFAChallenge
+func (MFAChallenge) TableName() string {
+	return "mfa_challenges"
+}
+
+// CreateInvitationRequest is a request to invite a user by email
+type CreateInvitationRequest struct {
+	Email    string     `json:"email"`
+	Username string     `json:"username"`
+	RoleID   *uuid.UUID `json:"roleId"`
+}
+
+// AcceptInvitationRequest is a request to create an account from an invitation
+type AcceptInvitationRequest struct {
+	Token       string `json:"token"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	DisplayName string `json:"displayName"`
+}
+
+// PasswordResetRequest asks for a password reset email
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// ConfirmPasswordResetRequest sets a new password with a reset token
+type ConfirmPasswordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// MFAEnrollment is the secret of a pending TOTP enrollment
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"` // otpauth:// URI for QR codes
+}
+
+// MFACodeRequest carries a TOTP or recovery code
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// MFAVerifyRequest completes a login that requires MFA
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"` // A TOTP code or an unused recovery code
+}
+
+// MFAStatus is the MFA state of a user
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled"`
+	Pending                bool       `json:"pending"` // Enrolled but not yet verified
+	EnabledAt              *time.Time `json:"enabledAt,omitempty"`
+	RecoveryCodesRemaining int64      `json:"recoveryCodesRemaining"`
+}
@@ -0,0 +1,124 @@
+// Package model provides data models for the agent command channel
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AgentCommandType represents the type of command sent to an agent
+type AgentCommandType string
+
+const (
+	AgentCommandProcessList       AgentCommandType = "process_list"
+	AgentCommandProcessRenice     AgentCommandType = "process_renice"
+	AgentCommandProcessIonice     AgentCommandType = "process_ionice"
+	AgentCommandServiceList       AgentCommandType = "service_list"
+	AgentCommandServiceControl    AgentCommandType = "service_control"
+	AgentCommandSyntheticProbe    AgentCommandType = "synthetic_probe"    // Args SyntheticProbeSpec, output SyntheticProbeResult
+	AgentCommandNetworkDiagnostic AgentCommandType = "network_diagnostic" // Args NetworkDiagnosticSpec, output the result of its type
+	AgentCommandBandwidthServer   AgentCommandType = "bandwidth_server"   // Args BandwidthServerSpec, output BandwidthServerInfo
+)
+
+// AgentCommandStatus represents the status of an agent command
+type AgentCommandStatus string
+
+const (
+	AgentCommandStatusPending    AgentCommandStatus = "pending"    // waiting for the agent to poll
+	AgentCommandStatusDispatched AgentCommandStatus = "dispatched" // picked up by the agent
+	AgentCommandStatusCompleted  AgentCommandStatus = "completed"
+	AgentCommandStatusFailed     AgentCommandStatus = "failed"
+	AgentCommandStatusTimeout    AgentCommandStatus = "timeout"
+)
+
+// AgentCommand represents a command queued for execution by a host agent
+type AgentCommand struct {
+	ID           uuid.UUID          `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	HostID       uuid.UUID          `json:"hostId" gorm:"type:uuid;not null;index"`
+	UserID       *uuid.UUID         `json:"userId,omitempty" gorm:"type:uuid;index"`
+	Type         AgentCommandType   `json:"type" gorm:"type:varchar(50);not null"`
+	Args         string             `json:"args" gorm:"type:jsonb;default:'{}'"` // JSON encoded arguments
+	Status       AgentCommandStatus `json:"status" gorm:"type:varchar(20);not null;index"`
+	ExitCode     *int32             `json:"exitCode,omitempty" gorm:"type:int"`
+	Output       string             `json:"output,omitempty" gorm:"type:text"`
+	ErrorMessage string             `json:"errorMessage,omitempty" gorm:"type:text"`
+	Timeout      int32              `json:"timeout" gorm:"type:int;default:30"`          // seconds
+	RequestID    string             `json:"requestId,omitempty" gorm:"type:varchar(64)"` // Correlation ID of the request that queued the command
+	DispatchedAt *time.Time         `json:"dispatchedAt,omitempty"`
+	CompletedAt  *time.Time         `json:"completedAt,omitempty"`
+	CreatedAt    time.Time          `json:"createdAt" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for AgentCommand
+func (AgentCommand) TableName() string {
+	return "agent_commands"
+}
+
+// IsFinished reports whether the command reached a terminal state
+func (c *AgentCommand) IsFinished() bool {
+	return c.Status == AgentCommandStatusCompleted ||
+		c.Status == AgentCommandStatusFailed ||
+		c.Status == AgentCommandStatusTimeout
+}
+
+// AgentCommandResult represents the result reported by an agent for a command
+type AgentCommandResult struct {
+	ExitCode int32  `json:"exitCode"`
+	Output   string `json:"output"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ReniceProcessRequest represents a request to change a process's CPU scheduling priority
+type ReniceProcessRequest struct {
+	HostID   uuid.UUID `json:"hostId"`
+	PID      int32     `json:"pid"`
+	Priority int32     `json:"priority"` // -20 (highest) to 19 (lowest)
+	Username string    `json:"username"`
+	Password string    `json:"password"`
+	Key      string    `json:"key"`
+}
+
+// IoniceProcessRequest represents a request to change a process's I/O scheduling class
+type IoniceProcessRequest struct {
+	HostID   uuid.UUID `json:"hostId"`
+	PID      int32     `json:"pid"`
+	Class    int32     `json:"class"` // 1 = realtime, 2 = best-effort, 3 = idle
+	Level    int32     `json:"level"` // 0 (highest) to 7 (lowest), ignored for idle
+	Username string    `json:"username"`
+	Password string    `json:"password"`
+	Key      string    `json:"key"`
+}
+
+// ServiceAction represents a systemd service control action
+type ServiceAction string
+
+const (
+	ServiceActionStart   ServiceAction = "start"
+	ServiceActionStop    ServiceAction = "stop"
+	ServiceActionRestart ServiceAction = "restart"
+	ServiceActionStatus  ServiceAction = "status"
+	ServiceActionEnable  ServiceAction = "enable"
+	ServiceActionDisable ServiceAction = "disable"
+)
+
+// IsValid reports whether the action is a supported service action
+func (a ServiceAction) IsValid() bool {
+	switch a {
+	case ServiceActionStart, ServiceActionStop, ServiceActionRestart,
+		ServiceActionStatus, ServiceActionEnable, ServiceActionDisable:
+		return true
+	}
+	return false
+}
+
+// ServiceInfo represents the state of a systemd service on a host
+type ServiceInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	LoadState   string `json:"loadState,omitempty"`
+	ActiveState string `json:"activeState"`
+	SubState    string `json:"subState,omitempty"`
+	UnitFile    string `json:"unitFileState,omitempty"` // enabled, disabled, static, ...
+	MainPID     int32  `json:"mainPid,omitempty"`
+}
@@ -0,0 +1,131 @@
+// Package model provides data models for agent plugins, the custom collectors
+// host agents run on a schedule
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// AgentCommandPluginSync replaces the plugin configuration of a host's agent
+const AgentCommandPluginSync AgentCommandType = "plugin_sync"
+
+// AgentPlugin is a custom collector run by the agents of matching hosts. The agent
+// runs Command from its plugin directory every Interval seconds and reports the
+// JSON it prints under the plugin's name.
+type AgentPlugin struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name        string         `json:"name" gorm:"type:varchar(63);not null;uniqueIndex"` // namespace of the reported data
+	Description string         `json:"description" gorm:"type:text"`
+	Command     string         `json:"command" gorm:"type:varchar(255);not null"` // executable in the agent's plugin directory
+	Args        pq.StringArray `json:"args" gorm:"type:text[];default:'{}'"`
+	Env         LabelMap       `json:"env" gorm:"type:jsonb;default:'{}'"`
+	Interval    int            `json:"interval" gorm:"not null;default:60"`      // seconds
+	Timeout     int            `json:"timeout" gorm:"not null;default:10"`       // seconds
+	HostTags    pq.StringArray `json:"hostTags" gorm:"type:text[];default:'{}'"` // runs on hosts with any of these tags, or on all hosts when empty
+	Enabled     bool           `json:"enabled" gorm:"not null;default:true"`
+	CreatedBy   *uuid.UUID     `json:"createdBy,omitempty" gorm:"type:uuid"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+}
+
+// TableName specifies the table name for AgentPlugin
+func (AgentPlugin) TableName() string {
+	return "agent_plugins"
+}
+
+// AppliesTo reports whether the plugin runs on the host
+func (p *AgentPlugin) AppliesTo(host *Host) bool {
+	if len(p.HostTags) == 0 {
+		return true
+	}
+	for _, want := range p.HostTags {
+		for _, tag := range host.Tags {
+			if tag == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AgentPluginSpec is a plugin as the agent runs it
+type AgentPluginSpec struct {
+	Name     string            `json:"name"`
+	Command  string            `json:"command"`
+	Args     []string          `json:"args,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	Interval int               `json:"interval"` // seconds
+	Timeout  int               `json:"timeout"`  // seconds
+}
+
+// AgentPluginSyncArgs are the arguments of a plugin_sync command: the complete
+// set of plugins the agent should run, and its hash
+type AgentPluginSyncArgs struct {
+	Plugins []AgentPluginSpec `json:"plugins"`
+	Hash    string            `json:"hash"`
+}
+
+// AgentPluginOutput is the latest run of a plugin as reported by an agent
+type AgentPluginOutput struct {
+	Data        json.RawMessage `json:"data,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	CollectedAt time.Time       `json:"collectedAt"`
+}
+
+// HostPluginData is the latest data a plugin reported for a host
+type HostPluginData struct {
+	HostID      uuid.UUID `json:"hostId" gorm:"type:uuid;primaryKey"`
+	Plugin      string    `json:"plugin" gorm:"type:varchar(63);primaryKey"`
+	Data        string    `json:"-" gorm:"type:jsonb"` // JSON printed by the plugin
+	Error       string    `json:"error,omitempty" gorm:"type:text"`
+	CollectedAt time.Time `json:"collectedAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// TableName specifies the table name for HostPluginData
+func (HostPluginData) TableName() string {
+	return "host_plugin_data"
+}
+
+// MarshalJSON embeds the plugin's data as JSON rather than as a string
+func (d HostPluginData) MarshalJSON() ([]byte, error) {
+	type plain HostPluginData
+	out := struct {
+		plain
+		Data json.RawMessage `json:"data"`
+	}{plain: plain(d)}
+	if d.Data != "" {
+		out.Data = json.RawMessage(d.Data)
+	}
+	return json.Marshal(out)
+}
+
+// CreateAgentPluginRequest represents a request to create an agent plugin
+type CreateAgentPluginRequest struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Command     string            `json:"command"`
+	Args        []string          `json:"args"`
+	Env         map[string]string `json:"env"`
+	Interval    int               `json:"interval"`
+	Timeout     int               `json:"timeout"`
+	HostTags    []string          `json:"hostTags"`
+	Enabled     *bool             `json:"enabled"`
+}
+
+// UpdateAgentPluginRequest represents a request to update an agent plugin.
+// Omitted fields keep their value.
+type UpdateAgentPluginRequest struct {
+	Description *string            `json:"description"`
+	Command     *string            `json:"command"`
+	Args        *[]string          `json:"args"`
+	Env         *map[string]string `json:"env"`
+	Interval    *int               `json:"interval"`
+	Timeout     *int               `json:"timeout"`
+	HostTags    *[]string          `json:"hostTags"`
+	Enabled     *bool              `json:"enabled"`
+}
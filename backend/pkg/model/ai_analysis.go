@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // AnomalyDetectionRule represents an anomaly detection rule configuration
@@ -19,8 +20,12 @@ type AnomalyDetectionRule struct {
 	Name         string    `gorm:"size:255;not null" json:"name"`
 	Description  string    `gorm:"type:text" json:"description,omitempty"`
 
-	// Detection configuration
+	// Detection configuration. Prometheus rules evaluate MetricQuery; host rules
+	// evaluate HostMetric on each host with any of HostTags, or on every host.
+	SourceType   string `gorm:"size:20;not null;default:prometheus" json:"sourceType"` // prometheus, host
 	MetricQuery  string `gorm:"type:text;not null" json:"metricQuery"` // PromQL query
+	HostMetric   string `gorm:"size:50" json:"hostMetric,omitempty"`
+	HostTags     pq.StringArray `gorm:"type:text[];default:'{}'" json:"hostTags,omitempty"`
 	Algorithm    string `gorm:"size:50;not null" json:"algorithm"`    // stl, isolation_forest, lstm, baseline
 	Sensitivity  float64 `gorm:"default:0.95" json:"sensitivity"`      // 0-1
 	WindowSize   int     `gorm:"default:100" json:"windowSize"`       // data points
@@ -56,6 +61,7 @@ type AnomalyEvent struct {
 	RuleID       uuid.UUID  `gorm:"type:uuid;not null;index:idx_anomaly_event_rule_id" json:"ruleId"`
 	UserID       uuid.UUID  `gorm:"type:uuid;not null;index:idx_anomaly_event_user_id" json:"userId"`
 	ClusterID    *uuid.UUID `gorm:"type:uuid;index:idx_anomaly_event_cluster_id" json:"clusterId,omitempty"`
+	HostID       *uuid.UUID `gorm:"type:uuid;index:idx_anomaly_event_host_id" json:"hostId,omitempty"` // set for host rules
 	Severity     string     `gorm:"size:50;not null" json:"severity"` // critical, warning, info
 
 	// Anomaly details
@@ -81,6 +87,7 @@ type AnomalyEvent struct {
 	// Relationships
 	Rule        *AnomalyDetectionRule `gorm:"foreignKey:RuleID" json:"rule,omitempty"`
 	Cluster     *K8sCluster           `gorm:"foreignKey:ClusterID" json:"cluster,omitempty"`
+	Host        *Host                 `gorm:"foreignKey:HostID" json:"host,omitempty"`
 }
 
 // AlertGroup represents a group of related alerts
@@ -107,6 +114,11 @@ type AlertGroup struct {
 	RootCause   string    `gorm:"type:text" json:"rootCause,omitempty"`
 	Confidence  float64   `json:"confidence,omitempty"`
 	Suggestions string    `gorm:"type:text" json:"suggestions,omitempty"`
+	AnalysisStatus string     `gorm:"size:20" json:"analysisStatus,omitempty"` // pending, completed, failed
+	AnalysisSource string     `gorm:"size:20" json:"analysisSource,omitempty"` // heuristic, llm
+	AnalysisError  string     `gorm:"type:text" json:"analysisError,omitempty"`
+	Evidence       string     `gorm:"type:text" json:"-"` // JSON AlertGroupEvidence
+	AnalyzedAt     *time.Time `json:"analyzedAt,omitempty"`
 
 	// Status
 	Status      string    `gorm:"size:50;default:AlertGroupStatusActive" json:"status"` // active, suppressed, resolved
@@ -150,10 +162,15 @@ type LLMMessage struct {
 	Role           string    `gorm:"size:20;not null" json:"role"` // user, assistant, system
 	Content        string    `gorm:"type:text;not null" json:"content"`
 	TokensUsed     int       `json:"tokensUsed,omitempty"`
+	PromptTokens     int     `json:"promptTokens,omitempty"`
+	CompletionTokens int     `json:"completionTokens,omitempty"`
+	Model            string  `gorm:"size:100" json:"model,omitempty"` // Model that wrote an assistant reply
+	Cost             float64 `json:"cost,omitempty"`                  // USD, priced when the reply was written
 
 	// Metadata
 	RelatedQuery   string    `gorm:"type:text" json:"relatedQuery,omitempty"` // The query that generated this response
 	RelatedData    string    `gorm:"type:text" json:"relatedData,omitempty"` // JSON: metrics, logs, traces referenced
+	ContextSnapshotID *uuid.UUID `gorm:"type:uuid" json:"contextSnapshotId,omitempty"` // Cluster context used for this reply
 
 	// Relationships
 	Conversation *LLMConversation `gorm:"foreignKey:ConversationID" json:"conversation,omitempty"`
@@ -275,6 +292,12 @@ const (
 	AlertGroupStatusResolved   = "resolved"
 )
 
+// Anomaly rule source types
+const (
+	AnomalySourcePrometheus = "prometheus"
+	AnomalySourceHost       = "host"
+)
+
 // Algorithm constants
 const (
 	AlgorithmSTL              = "stl"
@@ -289,7 +312,10 @@ type CreateAnomalyDetectionRuleRequest struct {
 	DataSourceID *uuid.UUID `json:"dataSourceId,omitempty"`
 	Name         string     `json:"name" binding:"required"`
 	Description  string     `json:"description,omitempty"`
-	MetricQuery  string     `json:"metricQuery" binding:"required"`
+	SourceType   string     `json:"sourceType,omitempty"` // prometheus when empty
+	MetricQuery  string     `json:"metricQuery"`          // required for prometheus rules
+	HostMetric   string     `json:"hostMetric,omitempty"` // required for host rules
+	HostTags     []string   `json:"hostTags,omitempty"`
 	Algorithm    string     `json:"algorithm" binding:"required,oneof=stl isolation_forest lstm baseline"`
 	Sensitivity  float64    `json:"sensitivity"`
 	WindowSize   int        `json:"windowSize"`
@@ -307,6 +333,8 @@ type UpdateAnomalyDetectionRuleRequest struct {
 	Name         *string  `json:"name,omitempty"`
 	Description  *string  `json:"description,omitempty"`
 	MetricQuery  *string  `json:"metricQuery,omitempty"`
+	HostMetric   *string  `json:"hostMetric,omitempty"`
+	HostTags     *[]string `json:"hostTags,omitempty"`
 	Algorithm    *string  `json:"algorithm,omitempty"`
 	Sensitivity  *float64 `json:"sensitivity,omitempty"`
 	WindowSize   *int     `json:"windowSize,omitempty"`
@@ -347,6 +375,11 @@ type CreateLLMConversationRequest struct {
 // SendLLMMessageRequest represents a request to send a message in a conversation
 type SendLLMMessageRequest struct {
 	Content string `json:"content" binding:"required"`
+	// Cluster context injection; by default every section is included when the conversation has a cluster
+	DisableContext  bool     `json:"disableContext,omitempty"`
+	ContextSections []string `json:"contextSections,omitempty"` // cluster, alerts, events, metrics
+	ContextBudget   int      `json:"contextBudget,omitempty"`   // Maximum context size in characters
+	DisableTools    bool     `json:"disableTools,omitempty"`    // Answer without running read-only tools
 }
 
 // SendLLMMessageResponse represents the response from sending a message
@@ -354,8 +387,12 @@ type SendLLMMessageResponse struct {
 	MessageID    string `json:"messageId"`
 	Content      string `json:"content"`
 	TokensUsed   int    `json:"tokensUsed"`
+	Cost         float64 `json:"cost,omitempty"`
+	BudgetWarning string `json:"budgetWarning,omitempty"` // Set when a soft token budget is used up
 	RelatedQuery string `json:"relatedQuery,omitempty"`
 	RelatedData  string `json:"relatedData,omitempty"`
+	ContextSnapshotID string `json:"contextSnapshotId,omitempty"`
+	ToolInvocations []LLMToolInvocation `json:"toolInvocations,omitempty"`
 }
 
 // ProcessNLQueryRequest represents a request to process a natural language query
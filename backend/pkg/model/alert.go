@@ -26,6 +26,17 @@ const (
 	AlertStatusSilenced AlertStatus = "silenced"
 )
 
+// Metric types of the alert rules other services manage and evaluate
+// themselves rather than the alert engine
+const (
+	AlertMetricSLOBurnRate       = "slo_burn_rate"      // Error budget burn rate of an SLO
+	AlertMetricSyntheticFailures = "synthetic_failures" // Failing locations of a synthetic check
+	AlertMetricRouteLatency      = "route_latency"      // Latency of a gateway route relative to its SLO
+)
+
+// ManagedAlertMetricTypes lists the metric types the alert engine leaves to their owners
+var ManagedAlertMetricTypes = []string{AlertMetricSLOBurnRate, AlertMetricSyntheticFailures, AlertMetricRouteLatency}
+
 // AlertRule represents an alert rule configuration
 type AlertRule struct {
 	ID          uuid.UUID    `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
@@ -37,7 +48,7 @@ type AlertRule struct {
 	TargetType  string `json:"targetType" gorm:"type:varchar(50);not null"` // host, cluster, node, pod
 	TargetID    string `json:"targetId" gorm:"type:varchar(255)"`
 	// Rule conditions
-	MetricType  string  `json:"metricType" gorm:"type:varchar(100);not null"` // cpu_usage, memory_usage, disk_usage, pod_status, node_status
+	MetricType  string  `json:"metricType" gorm:"type:varchar(100);not null"` // cpu_usage, memory_usage, disk_usage, host_heartbeat_age, pod_status, node_status, slo_burn_rate, synthetic_failures, route_latency
 	Operator    string  `json:"operator" gorm:"type:varchar(20);not null"`    // >, <, >=, <=, ==, !=
 	Threshold   float64 `json:"threshold" gorm:"type:decimal(10,2);not null"`
 	Duration    int32   `json:"duration" gorm:"type:int;default:300"`           // seconds
@@ -72,9 +83,14 @@ type Alert struct {
 	UpdatedAt   time.Time `json:"updatedAt" gorm:"not null"`
 	ResolvedAt  *time.Time `json:"resolvedAt,omitempty"`
 	SilencedUntil *time.Time `json:"silencedUntil,omitempty"`
+	// Acknowledgement by whoever is handling the alert
+	AcknowledgedAt *time.Time `json:"acknowledgedAt,omitempty"`
+	AcknowledgedBy *uuid.UUID `json:"acknowledgedBy,omitempty" gorm:"type:uuid"`
 	// Labels for filtering
 	Labels      string   `json:"labels" gorm:"type:text"` // JSON
 	Annotations string   `json:"annotations" gorm:"type:text"` // JSON
+	// Issues opened for the alert in ticketing systems
+	Tickets []AlertTicket `json:"tickets,omitempty" gorm:"foreignKey:AlertID"`
 }
 
 // Event represents a system event
@@ -111,3 +127,20 @@ type AlertStatistics struct {
 	CriticalAlerts int64 `json:"criticalAlerts"`
 	WarningAlerts  int64 `json:"warningAlerts"`
 }
+
+// InboundEmail is an email the inbound email webhook receives, such as a reply
+// to an alert email
+type InboundEmail struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"` // Plain text body
+}
+
+// EmailReplyResult reports what a reply to an alert email did
+type EmailReplyResult struct {
+	Status  string     `json:"status"` // applied, ignored, failed
+	Action  string     `json:"action,omitempty"`
+	AlertID *uuid.UUID `json:"alertId,omitempty"`
+	Message string     `json:"message"`
+}
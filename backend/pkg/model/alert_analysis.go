@@ -0,0 +1,73 @@
+// Package model provides data models for alert group root-cause analysis
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Alert group analysis status constants
+const (
+	AlertAnalysisPending   = "pending"
+	AlertAnalysisCompleted = "completed"
+	AlertAnalysisFailed    = "failed"
+)
+
+// Alert group analysis source constants
+const (
+	AlertAnalysisSourceHeuristic = "heuristic"
+	AlertAnalysisSourceLLM       = "llm"
+)
+
+// AlertGroupAlert summarizes one alert in a group
+type AlertGroupAlert struct {
+	ID        uuid.UUID     `json:"id"`
+	Title     string        `json:"title"`
+	Severity  AlertSeverity `json:"severity"`
+	Status    AlertStatus   `json:"status"`
+	Value     float64       `json:"value"`
+	Threshold float64       `json:"threshold"`
+	StartedAt time.Time     `json:"startedAt"`
+}
+
+// AlertGroupEvent is a Kubernetes warning event seen around the alerts
+type AlertGroupEvent struct {
+	Namespace string    `json:"namespace,omitempty"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Count     int32     `json:"count"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// AlertGroupEvidence holds the signals gathered for an alert group's analysis.
+// Errors maps a signal (events, metrics, logs) to why it could not be gathered.
+type AlertGroupEvidence struct {
+	WindowStart time.Time         `json:"windowStart"`
+	WindowEnd   time.Time         `json:"windowEnd"`
+	Alerts      []AlertGroupAlert `json:"alerts"`
+	Events      []AlertGroupEvent `json:"events"`
+	Metrics     []MetricSeries    `json:"metrics"`
+	Logs        []LogEntry        `json:"logs"`
+	Errors      map[string]string `json:"errors,omitempty"`
+}
+
+// AlertGroupAnalysis is the root-cause analysis of an alert group
+type AlertGroupAnalysis struct {
+	GroupID     uuid.UUID           `json:"groupId"`
+	Status      string              `json:"status"`
+	Source      string              `json:"source,omitempty"`
+	RootCause   string              `json:"rootCause,omitempty"`
+	Confidence  float64             `json:"confidence"`
+	Suggestions []string            `json:"suggestions"`
+	Evidence    *AlertGroupEvidence `json:"evidence,omitempty"`
+	Error       string              `json:"error,omitempty"`
+	AnalyzedAt  *time.Time          `json:"analyzedAt,omitempty"`
+}
+
+// RegenerateAlertGroupAnalysisRequest asks for an alert group to be analyzed again
+type RegenerateAlertGroupAnalysisRequest struct {
+	DisableLLM bool `json:"disableLLM,omitempty"` // Only use the built-in heuristics
+}
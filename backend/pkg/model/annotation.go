@@ -0,0 +1,168 @@
+// Package model provides data models for dashboard annotations
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// AnnotationKind is what an annotation records
+type AnnotationKind string
+
+const (
+	AnnotationDeployment  AnnotationKind = "deployment"
+	AnnotationIncident    AnnotationKind = "incident"
+	AnnotationMaintenance AnnotationKind = "maintenance"
+	AnnotationCustom      AnnotationKind = "custom"
+)
+
+// IsValid reports whether the kind is supported
+func (k AnnotationKind) IsValid() bool {
+	switch k {
+	case AnnotationDeployment, AnnotationIncident, AnnotationMaintenance, AnnotationCustom:
+		return true
+	}
+	return false
+}
+
+// Sources of annotations
+const (
+	AnnotationSourceManual      = "manual"      // Recorded through the API
+	AnnotationSourceWebhook     = "webhook"     // Posted to an annotation webhook, e.g. by a CI pipeline
+	AnnotationSourceMaintenance = "maintenance" // An occurrence of a maintenance window, not stored
+	AnnotationSourceHelm        = "helm"        // An install, upgrade or rollback of a Helm release
+)
+
+// Annotation is an event shown on the graphs of dashboards, at a point in time
+// or over a range. It applies to one dashboard, to the dashboards of a cluster,
+// or to every dashboard of its owner.
+type Annotation struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID      `json:"userId" gorm:"type:uuid;not null;index"`
+	DashboardID *uuid.UUID     `json:"dashboardId,omitempty" gorm:"type:uuid;index"`
+	ClusterID   *uuid.UUID     `json:"clusterId,omitempty" gorm:"type:uuid;index"`
+	Kind        AnnotationKind `json:"kind" gorm:"type:varchar(20);not null"`
+	Title       string         `json:"title" gorm:"type:varchar(255);not null"`
+	Text        string         `json:"text,omitempty" gorm:"type:text"`
+	Tags        pq.StringArray `json:"tags" gorm:"type:text[]"`
+	StartsAt    time.Time      `json:"startsAt" gorm:"not null;index"`
+	EndsAt      *time.Time     `json:"endsAt,omitempty"` // Empty for a point in time
+	Source      string         `json:"source" gorm:"type:varchar(20);not null"`
+	SourceID    string         `json:"sourceId,omitempty" gorm:"type:varchar(255)"` // e.g. the webhook that posted it
+	CreatedBy   string         `json:"createdBy,omitempty" gorm:"type:varchar(255)"`
+	CreatedAt   time.Time      `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time      `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for Annotation
+func (Annotation) TableName() string {
+	return "annotations"
+}
+
+// AnnotationWebhook lets a system without a user session, such as a deploy
+// pipeline, record annotations by presenting its token. The annotations get
+// the webhook's kind, scope and tags.
+type AnnotationWebhook struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID      `json:"userId" gorm:"type:uuid;not null;index"`
+	Name        string         `json:"name" gorm:"type:varchar(255);not null"`
+	Kind        AnnotationKind `json:"kind" gorm:"type:varchar(20);not null"`
+	DashboardID *uuid.UUID     `json:"dashboardId,omitempty" gorm:"type:uuid"`
+	ClusterID   *uuid.UUID     `json:"clusterId,omitempty" gorm:"type:uuid"`
+	Tags        pq.StringArray `json:"tags" gorm:"type:text[]"`
+	TokenHash   string         `json:"-" gorm:"type:varchar(64);not null"` // SHA-256 of the token callers present
+	LastUsedAt  *time.Time     `json:"lastUsedAt,omitempty"`
+	CreatedAt   time.Time      `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time      `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for AnnotationWebhook
+func (AnnotationWebhook) TableName() string {
+	return "annotation_webhooks"
+}
+
+// CreateAnnotationRequest records an annotation. StartsAt defaults to now; at
+// most one of DashboardID and ClusterID scopes it.
+type CreateAnnotationRequest struct {
+	DashboardID *uuid.UUID     `json:"dashboardId,omitempty"`
+	ClusterID   *uuid.UUID     `json:"clusterId,omitempty"`
+	Kind        AnnotationKind `json:"kind"`
+	Title       string         `json:"title"`
+	Text        string         `json:"text,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	StartsAt    *time.Time     `json:"startsAt,omitempty"`
+	EndsAt      *time.Time     `json:"endsAt,omitempty"`
+}
+
+// UpdateAnnotationRequest changes the fields it sets; an EndsAt of the zero time
+// makes the annotation a point in time
+type UpdateAnnotationRequest struct {
+	Kind     *AnnotationKind `json:"kind,omitempty"`
+	Title    *string         `json:"title,omitempty"`
+	Text     *string         `json:"text,omitempty"`
+	Tags     *[]string       `json:"tags,omitempty"`
+	StartsAt *time.Time      `json:"startsAt,omitempty"`
+	EndsAt   *time.Time      `json:"endsAt,omitempty"`
+}
+
+// AnnotationFilter selects annotations overlapping From and To. Tags match
+// annotations with any of them.
+type AnnotationFilter struct {
+	From        *time.Time
+	To          *time.Time
+	Kind        AnnotationKind
+	Tags        []string
+	DashboardID *uuid.UUID
+	ClusterID   *uuid.UUID
+}
+
+// CreateAnnotationWebhookRequest represents a request to create an annotation webhook
+type CreateAnnotationWebhookRequest struct {
+	Name        string         `json:"name"`
+	Kind        AnnotationKind `json:"kind,omitempty"` // deployment by default
+	DashboardID *uuid.UUID     `json:"dashboardId,omitempty"`
+	ClusterID   *uuid.UUID     `json:"clusterId,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+}
+
+// AnnotationWebhookToken is a webhook with its token, returned only when the
+// webhook is created or its token rotated
+type AnnotationWebhookToken struct {
+	AnnotationWebhook
+	Token string `json:"token"`
+}
+
+// InboundAnnotationRequest is what callers of an annotation webhook post. Tags
+// are added to the webhook's; the kind overrides the webhook's when set.
+type InboundAnnotationRequest struct {
+	Kind     AnnotationKind `json:"kind,omitempty"`
+	Title    string         `json:"title"`
+	Text     string         `json:"text,omitempty"`
+	Tags     []string       `json:"tags,omitempty"`
+	StartsAt *time.Time     `json:"startsAt,omitempty"`
+	EndsAt   *time.Time     `json:"endsAt,omitempty"`
+}
+
+// DashboardAnnotationFilter narrows the annotations a dashboard shows; empty
+// lists show every kind and tag
+type DashboardAnnotationFilter struct {
+	Disabled bool             `json:"disabled,omitempty"`
+	Kinds    []AnnotationKind `json:"kinds,omitempty"`
+	Tags     []string         `json:"tags,omitempty"` // Annotations with any of them
+}
+
+// DashboardAnnotation is an annotation in the window of a render, including the
+// occurrences of maintenance windows, which have no ID
+type DashboardAnnotation struct {
+	ID       *uuid.UUID     `json:"id,omitempty"`
+	Kind     AnnotationKind `json:"kind"`
+	Title    string         `json:"title"`
+	Text     string         `json:"text,omitempty"`
+	Tags     []string       `json:"tags"`
+	Time     time.Time      `json:"time"`
+	TimeEnd  *time.Time     `json:"timeEnd,omitempty"`
+	Source   string         `json:"source"`
+	SourceID string         `json:"sourceId,omitempty"`
+}
@@ -0,0 +1,32 @@
+// Package model provides batch API models
+package model
+
+import "encoding/json"
+
+// APIBatchRequest runs several GET requests in one round trip
+type APIBatchRequest struct {
+	Requests []APIBatchItem `json:"requests"`
+}
+
+// APIBatchItem is one request of a batch. Path is an /api/v1 path with its query
+// string; an ID, defaulting to the item's index, matches it to its result.
+type APIBatchItem struct {
+	ID     string `json:"id,omitempty"`
+	Method string `json:"method,omitempty"` // Only GET, the default
+	Path   string `json:"path"`
+}
+
+// APIBatchResult is the response to one item of a batch. Body is the JSON the
+// item's endpoint answered with; items refused by the batch itself carry Error.
+type APIBatchResult struct {
+	ID     string          `json:"id"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Error  *APIBatchError  `json:"error,omitempty"`
+}
+
+// APIBatchError says why the batch refused or could not run an item
+type APIBatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
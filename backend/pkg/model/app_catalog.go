@@ -0,0 +1,118 @@
+// Package model provides data models for the app catalog: curated applications
+// installed into clusters as Helm releases and tracked through their lifecycle
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AppInputType is the kind of value an app's install form asks for
+type AppInputType string
+
+const (
+	AppInputString  AppInputType = "string"
+	AppInputInteger AppInputType = "integer"
+	AppInputBoolean AppInputType = "boolean"
+	AppInputSelect  AppInputType = "select" // One of Options
+)
+
+// AppCatalogInput is a field of an app's install form, set in the chart's
+// values at Key
+type AppCatalogInput struct {
+	Key         string       `json:"key"` // Dotted values path, e.g. controller.replicaCount
+	Label       string       `json:"label"`
+	Description string       `json:"description,omitempty"`
+	Type        AppInputType `json:"type"`
+	Default     interface{}  `json:"default,omitempty"`
+	Required    bool         `json:"required,omitempty"`
+	Options     []string     `json:"options,omitempty"`
+	Pattern     string       `json:"pattern,omitempty"` // Regular expression strings must match
+	Minimum     *int64       `json:"minimum,omitempty"`
+	Maximum     *int64       `json:"maximum,omitempty"`
+	Secret      bool         `json:"secret,omitempty"` // Passwords and keys; kept only in the release's values
+}
+
+// AppCatalogEntry is a curated application: a chart of a public repository
+// with the values the platform installs it with and the inputs users fill in
+type AppCatalogEntry struct {
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	Description      string            `json:"description"`
+	Category         string            `json:"category"`
+	Icon             string            `json:"icon,omitempty"`
+	Home             string            `json:"home,omitempty"`
+	Repository       string            `json:"repository"` // Name the repository is registered under
+	RepositoryURL    string            `json:"repositoryUrl"`
+	Chart            string            `json:"chart"`
+	ChartVersion     string            `json:"chartVersion"`
+	DefaultNamespace string            `json:"defaultNamespace"`
+	DefaultValues    string            `json:"defaultValues"` // YAML the inputs are set in
+	Inputs           []AppCatalogInput `json:"inputs"`
+	MinDeployments   int               `json:"minDeployments"` // Deployments of the release that must be available
+}
+
+// AppInstallationStatus is where an installed app is in its lifecycle
+type AppInstallationStatus string
+
+const (
+	AppInstalling  AppInstallationStatus = "installing"
+	AppUpgrading   AppInstallationStatus = "upgrading"
+	AppHealthy     AppInstallationStatus = "healthy"
+	AppDegraded    AppInstallationStatus = "degraded"    // Was healthy and its health checks now fail
+	AppFailed      AppInstallationStatus = "failed"      // Did not become healthy after installing or upgrading
+	AppUninstalled AppInstallationStatus = "uninstalled" // Kept for the record
+)
+
+// AppHealthCheck is the result of one of an installed app's health checks
+type AppHealthCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// AppInstallation is an app of the catalog installed in a cluster through a
+// Helm release
+type AppInstallation struct {
+	ID              uuid.UUID              `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID          uuid.UUID              `gorm:"type:uuid;not null;index" json:"userId"`
+	AppID           string                 `gorm:"size:100;not null;index" json:"appId"`
+	ClusterID       uuid.UUID              `gorm:"type:uuid;not null;index" json:"clusterId"`
+	Namespace       string                 `gorm:"size:63;not null" json:"namespace"`
+	ReleaseName     string                 `gorm:"size:53;not null" json:"releaseName"`
+	ReleaseID       uuid.UUID              `gorm:"type:uuid;not null" json:"releaseId"`
+	ChartVersion    string                 `gorm:"size:50" json:"chartVersion"`
+	Inputs          map[string]interface{} `gorm:"serializer:json;type:jsonb" json:"inputs"` // Without the secret ones
+	Status          AppInstallationStatus  `gorm:"size:20;not null;index" json:"status"`
+	StatusChangedAt time.Time              `gorm:"not null" json:"statusChangedAt"`
+	Checks          []AppHealthCheck       `gorm:"serializer:json;type:jsonb" json:"checks"`
+	CheckedAt       *time.Time             `json:"checkedAt,omitempty"`
+	Notify          bool                   `json:"notify"` // Send health changes to the user's notification channels
+	CreatedBy       string                 `gorm:"size:255" json:"createdBy,omitempty"`
+	CreatedAt       time.Time              `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time              `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// TableName specifies the table name for AppInstallation
+func (AppInstallation) TableName() string {
+	return "app_installations"
+}
+
+// InstallAppRequest installs an app of the catalog. The namespace and release
+// name default to the app's.
+type InstallAppRequest struct {
+	ClusterID   uuid.UUID              `json:"clusterId"`
+	Namespace   string                 `json:"namespace"`
+	ReleaseName string                 `json:"releaseName"`
+	Inputs      map[string]interface{} `json:"inputs"`
+	Notify      bool                   `json:"notify,omitempty"`
+}
+
+// UpgradeAppRequest changes the inputs of an installed app or moves it to
+// another chart version. Inputs left out keep their current values.
+type UpgradeAppRequest struct {
+	ChartVersion string                 `json:"chartVersion"`
+	Inputs       map[string]interface{} `json:"inputs"`
+	Notify       *bool                  `json:"notify,omitempty"`
+}
@@ -28,6 +28,10 @@ type AuditLog struct {
 	NewValue    string    `json:"newValue" gorm:"type:text"`     // JSON of new state
 	// Metadata
 	CreatedAt   time.Time `json:"createdAt" gorm:"autoCreateTime;index:idx_user_action_time"`
+	// Hash chain, set when the record is sealed; sealed records cannot be changed
+	Sequence    *int64    `json:"sequence,omitempty" gorm:"uniqueIndex:idx_audit_logs_sequence"`
+	PrevHash    string    `json:"prevHash,omitempty" gorm:"type:varchar(64)"`
+	Hash        string    `json:"hash,omitempty" gorm:"type:varchar(64)"`
 }
 
 // OperationType represents the type of operation
@@ -0,0 +1,58 @@
+// Package model provides data models for the tamper-evident audit log chain
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Problems verification finds in the audit log chain
+const (
+	AuditChainGap                = "gap"                 // Sealed records are missing, such as deleted ones
+	AuditChainHashMismatch       = "hash_mismatch"       // A record changed after it was sealed
+	AuditChainBreak              = "chain_break"         // A record does not follow the one before it
+	AuditChainCheckpointMismatch = "checkpoint_mismatch" // The chain no longer matches a checkpoint
+)
+
+// AuditCheckpoint anchors the audit log chain: it records the hash of the chain
+// at a sequence, and where the records up to it were exported to. A chain
+// rewritten after a checkpoint no longer matches it or its export.
+type AuditCheckpoint struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+
+	FromSequence int64  `gorm:"not null" json:"fromSequence"` // First record since the previous checkpoint
+	Sequence     int64  `gorm:"not null;uniqueIndex" json:"sequence"`
+	Hash         string `gorm:"size:64;not null" json:"hash"` // Hash of the record at Sequence
+
+	ExportTargetID *uuid.UUID `gorm:"type:uuid" json:"exportTargetId,omitempty"`
+	ExportKey      string     `gorm:"size:1024" json:"exportKey,omitempty"`
+	ExportedAt     *time.Time `json:"exportedAt,omitempty"`
+	ExportError    string     `gorm:"type:text" json:"exportError,omitempty"`
+}
+
+// TableName specifies the table name for AuditCheckpoint
+func (AuditCheckpoint) TableName() string {
+	return "audit_checkpoints"
+}
+
+// AuditChainProblem is a place the audit log chain fails verification
+type AuditChainProblem struct {
+	Sequence int64  `json:"sequence"`
+	Kind     string `json:"kind"`
+	Message  string `json:"message"`
+}
+
+// AuditChainVerification is the result of verifying the audit log chain
+type AuditChainVerification struct {
+	Valid         bool                `json:"valid"`
+	FirstSequence int64               `json:"firstSequence"`
+	LastSequence  int64               `json:"lastSequence"`
+	Checked       int64               `json:"checked"`     // Records whose hashes were checked
+	Checkpoints   int                 `json:"checkpoints"` // Checkpoints the chain was checked against
+	Unsealed      int64               `json:"unsealed"`    // Records not yet in the chain
+	Problems      []AuditChainProblem `json:"problems"`
+	Truncated     bool                `json:"truncated,omitempty"` // More problems were found than are listed
+	VerifiedAt    time.Time           `json:"verifiedAt"`
+}
@@ -0,0 +1,167 @@
+// Package model provides data models for platform backups
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BackupFormatVersion is the layout of backup archives this build writes and restores
+const BackupFormatVersion = 1
+
+// BackupStorageType is where a backup target keeps its archives
+type BackupStorageType string
+
+const (
+	BackupStorageLocal BackupStorageType = "local" // A directory on the gateway host
+	BackupStorageS3    BackupStorageType = "s3"    // An S3 or S3-compatible bucket
+)
+
+// BackupTarget is a storage location backups are written to, with its schedule and
+// retention
+type BackupTarget struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	CreatedBy uuid.UUID         `gorm:"type:uuid;not null" json:"createdBy"`
+	Name      string            `gorm:"size:255;not null;uniqueIndex" json:"name"`
+	Type      BackupStorageType `gorm:"size:20;not null" json:"type"`
+	Enabled   bool              `gorm:"default:true" json:"enabled"`
+
+	// Local storage
+	Path string `gorm:"size:1024" json:"path,omitempty"`
+
+	// S3 storage
+	Bucket          string `gorm:"size:255" json:"bucket,omitempty"`
+	Prefix          string `gorm:"size:1024" json:"prefix,omitempty"`
+	Region          string `gorm:"size:50" json:"region,omitempty"`
+	Endpoint        string `gorm:"size:1024" json:"endpoint,omitempty"` // S3-compatible services; AWS when empty
+	AccessKeyID     string `gorm:"size:255" json:"accessKeyId,omitempty"`
+	SecretAccessKey string `gorm:"size:1024" json:"-"`
+
+	// Schedule and retention
+	Interval      int        `gorm:"default:86400" json:"interval"`  // seconds between scheduled backups; 0 only backs up on request
+	KeepLast      int        `gorm:"default:7" json:"keepLast"`      // Completed backups kept; 0 keeps all
+	RetentionDays int        `gorm:"default:0" json:"retentionDays"` // Older completed backups are deleted; 0 keeps them
+	NextRunAt     *time.Time `gorm:"index" json:"nextRunAt,omitempty"`
+}
+
+// TableName specifies the table name for BackupTarget
+func (BackupTarget) TableName() string {
+	return "backup_targets"
+}
+
+// CreateBackupTargetRequest is a request to add a backup target
+type CreateBackupTargetRequest struct {
+	Name            string            `json:"name"`
+	Type            BackupStorageType `json:"type"`
+	Enabled         *bool             `json:"enabled,omitempty"` // true when omitted
+	Path            string            `json:"path,omitempty"`
+	Bucket          string            `json:"bucket,omitempty"`
+	Prefix          string            `json:"prefix,omitempty"`
+	Region          string            `json:"region,omitempty"`
+	Endpoint        string            `json:"endpoint,omitempty"`
+	AccessKeyID     string            `json:"accessKeyId,omitempty"`
+	SecretAccessKey string            `json:"secretAccessKey,omitempty"`
+	Interval        *int              `json:"interval,omitempty"` // One day when omitted
+	KeepLast        *int              `json:"keepLast,omitempty"` // 7 when omitted
+	RetentionDays   int               `json:"retentionDays,omitempty"`
+}
+
+// UpdateBackupTargetRequest changes the given fields of a backup target
+type UpdateBackupTargetRequest struct {
+	Name            *string `json:"name,omitempty"`
+	Enabled         *bool   `json:"enabled,omitempty"`
+	Path            *string `json:"path,omitempty"`
+	Bucket          *string `json:"bucket,omitempty"`
+	Prefix          *string `json:"prefix,omitempty"`
+	Region          *string `json:"region,omitempty"`
+	Endpoint        *string `json:"endpoint,omitempty"`
+	AccessKeyID     *string `json:"accessKeyId,omitempty"`
+	SecretAccessKey *string `json:"secretAccessKey,omitempty"`
+	Interval        *int    `json:"interval,omitempty"`
+	KeepLast        *int    `json:"keepLast,omitempty"`
+	RetentionDays   *int    `json:"retentionDays,omitempty"`
+}
+
+// BackupStatus is the state of a backup
+type BackupStatus string
+
+const (
+	BackupRunning   BackupStatus = "running"
+	BackupCompleted BackupStatus = "completed"
+	BackupFailed    BackupStatus = "failed"
+)
+
+// Backup triggers
+const (
+	BackupTriggerManual    = "manual"
+	BackupTriggerScheduled = "scheduled"
+)
+
+// Backup is one archive of the platform database and configuration
+type Backup struct {
+	ID            uuid.UUID    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	TargetID      uuid.UUID    `gorm:"type:uuid;not null;index" json:"targetId"`
+	TargetName    string       `gorm:"size:255" json:"targetName"`
+	Status        BackupStatus `gorm:"size:20;not null;index" json:"status"`
+	Trigger       string       `gorm:"size:20;not null" json:"trigger"`
+	TriggeredBy   *uuid.UUID   `gorm:"type:uuid" json:"triggeredBy,omitempty"`
+	Key           string       `gorm:"size:1024" json:"key"` // Object key or file name in the target
+	Size          int64        `json:"size"`
+	Checksum      string       `gorm:"size:64" json:"checksum,omitempty"` // SHA-256 of the archive
+	SchemaVersion uint64       `json:"schemaVersion"`
+	Error         string       `gorm:"type:text" json:"error,omitempty"`
+	StartedAt     time.Time    `json:"startedAt"`
+	CompletedAt   *time.Time   `json:"completedAt,omitempty"`
+	CreatedAt     time.Time    `gorm:"autoCreateTime;index" json:"createdAt"`
+}
+
+// TableName specifies the table name for Backup
+func (Backup) TableName() string {
+	return "backups"
+}
+
+// BackupFilter selects backups
+type BackupFilter struct {
+	TargetID *uuid.UUID
+	Status   BackupStatus
+	Limit    int
+	Offset   int
+}
+
+// BackupManifest describes the contents of a backup archive. It is the archive's
+// first file, so a restore can check it before reading the rest.
+type BackupManifest struct {
+	FormatVersion   int       `json:"formatVersion"`
+	CreatedAt       time.Time `json:"createdAt"`
+	SchemaVersion   uint64    `json:"schemaVersion"` // golang-migrate version of the database
+	Database        string    `json:"database"`
+	PostgresVersion string    `json:"postgresVersion"`
+	DumpChecksum    string    `json:"dumpChecksum"` // SHA-256 of database.dump
+	Files           []string  `json:"files"`
+}
+
+// BackupTargetHealth is whether a target's backups are happening
+type BackupTargetHealth struct {
+	TargetID      uuid.UUID  `json:"targetId"`
+	TargetName    string     `json:"targetName"`
+	Enabled       bool       `json:"enabled"`
+	Interval      int        `json:"interval"`
+	LastSuccess   *Backup    `json:"lastSuccess,omitempty"`
+	LastFailure   *Backup    `json:"lastFailure,omitempty"`
+	NextRunAt     *time.Time `json:"nextRunAt,omitempty"`
+	Overdue       bool       `json:"overdue"` // No completed backup within twice the interval
+	Backups       int64      `json:"backups"` // Completed backups kept
+	TotalSize     int64      `json:"totalSize"`
+	Running       bool       `json:"running"`
+	OverdueReason string     `json:"overdueReason,omitempty"`
+}
+
+// BackupOverview is the state of backups across targets
+type BackupOverview struct {
+	Healthy bool                 `json:"healthy"` // Every enabled scheduled target is on time
+	Targets []BackupTargetHealth `json:"targets"`
+}
@@ -25,6 +25,7 @@ const (
 	BatchTaskTypeCommand  BatchTaskType = "command"
 	BatchTaskTypeScript   BatchTaskType = "script"
 	BatchTaskTypeFileOp   BatchTaskType = "file_op"
+	BatchTaskTypeFileDistribution BatchTaskType = "file_distribution"
 )
 
 // TaskExecutionStrategy defines how tasks are executed across hosts
@@ -71,6 +72,8 @@ type BatchTaskHost struct {
 	Duration        int64              `json:"duration" gorm:"type:bigint"` // Duration in milliseconds
 	ErrorMessage    string             `json:"errorMessage" gorm:"type:text"`
 	RetryCount      int32              `json:"retryCount" gorm:"type:int;default:0"`
+	Checksum        string             `json:"checksum,omitempty" gorm:"type:varchar(64)"` // Checksum observed on the host (file distribution)
+	Verified        bool               `json:"verified" gorm:"default:false"`
 	StartedAt       *time.Time         `json:"startedAt" gorm:"type:timestamp"`
 	CompletedAt     *time.Time         `json:"completedAt" gorm:"type:timestamp"`
 	CreatedAt       time.Time          `json:"createdAt" gorm:"type:timestamp;autoCreateTime"`
@@ -0,0 +1,157 @@
+// Package model provides data models for canary and blue/green rollouts of
+// deployments, which shift traffic to a new image in steps and roll back when
+// its metrics, SLOs or alerts regress
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CanaryStrategy is how a rollout moves traffic to the new image
+type CanaryStrategy string
+
+const (
+	CanaryStrategyCanary    CanaryStrategy = "canary"     // A growing share of traffic, step by step
+	CanaryStrategyBlueGreen CanaryStrategy = "blue_green" // All traffic at once to a full copy, switched back on regression
+)
+
+// CanaryTraffic is what splits traffic between the stable and new pods
+type CanaryTraffic string
+
+const (
+	// CanaryTrafficService shares the Service between both deployments, in
+	// proportion to their replicas. Blue/green rollouts switch the Service's
+	// selector between them.
+	CanaryTrafficService CanaryTraffic = "service"
+	// CanaryTrafficNginx weights an ingress-nginx canary ingress routing to a
+	// Service of the new pods
+	CanaryTrafficNginx CanaryTraffic = "nginx"
+)
+
+// CanaryRolloutStatus is the state of a rollout
+type CanaryRolloutStatus string
+
+const (
+	CanaryProgressing CanaryRolloutStatus = "progressing" // Shifting traffic or analyzing a step
+	CanaryPaused      CanaryRolloutStatus = "paused"      // Waiting to be promoted to its next step
+	CanaryPromoting   CanaryRolloutStatus = "promoting"   // Rolling the new image out to the stable deployment
+	CanaryPromoted    CanaryRolloutStatus = "promoted"
+	CanaryRolledBack  CanaryRolloutStatus = "rolled_back" // Aborted, or its analysis regressed, and its traffic was restored
+	CanaryFailed      CanaryRolloutStatus = "failed"      // It could not be rolled back; see its message
+)
+
+// CanaryActiveStatuses are the statuses of rollouts still running
+var CanaryActiveStatuses = []CanaryRolloutStatus{CanaryProgressing, CanaryPaused, CanaryPromoting}
+
+// CanaryStep is a share of traffic held for a while, during which the
+// rollout's analysis must keep passing
+type CanaryStep struct {
+	Weight   int  `json:"weight"`   // percent of traffic to the new image
+	Duration int  `json:"duration"` // seconds held once the traffic shifted
+	Manual   bool `json:"manual"`   // Wait to be promoted before shifting to the step
+}
+
+// CanaryMetric is a Prometheus query whose result must stay within bounds
+// while traffic is on the new image, e.g. its 5xx ratio below 0.01
+type CanaryMetric struct {
+	Name         string    `json:"name"`
+	DataSourceID uuid.UUID `json:"dataSourceId"`
+	Query        string    `json:"query"` // Instant query; the values of its series are summed
+	Max          *float64  `json:"max,omitempty"`
+	Min          *float64  `json:"min,omitempty"`
+}
+
+// CanaryCheck is the result of one check of an analysis
+type CanaryCheck struct {
+	Kind    string   `json:"kind"` // metric, slo or alerts
+	Name    string   `json:"name"`
+	Value   *float64 `json:"value,omitempty"`
+	Passed  bool     `json:"passed"`
+	Message string   `json:"message,omitempty"`
+}
+
+// CanaryAnalysis is one evaluation of a rollout's checks
+type CanaryAnalysis struct {
+	At     time.Time     `json:"at"`
+	Step   int           `json:"step"`
+	Weight int           `json:"weight"`
+	Passed bool          `json:"passed"`
+	Checks []CanaryCheck `json:"checks"`
+}
+
+// CanaryRollout moves a deployment to a new image through a copy of it, the
+// canary, and the rollout's traffic routing. It is promoted by setting the
+// image on the deployment once the last step passed, and rolled back by
+// removing the canary.
+type CanaryRollout struct {
+	ID               uuid.UUID           `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID           uuid.UUID           `gorm:"type:uuid;not null;index" json:"userId"`
+	ClusterID        uuid.UUID           `gorm:"type:uuid;not null;index" json:"clusterId"`
+	Namespace        string              `gorm:"size:63;not null" json:"namespace"`
+	Deployment       string              `gorm:"size:253;not null" json:"deployment"`
+	Container        string              `gorm:"size:253;not null" json:"container"`
+	Image            string              `gorm:"size:500;not null" json:"image"`
+	Previous         string              `gorm:"size:500" json:"previous,omitempty"` // The stable image
+	Strategy         CanaryStrategy      `gorm:"size:20;not null" json:"strategy"`
+	Traffic          CanaryTraffic       `gorm:"size:20;not null" json:"traffic"`
+	Service          string              `gorm:"size:63;not null" json:"service"`
+	Ingress          string              `gorm:"size:253" json:"ingress,omitempty"` // nginx traffic only
+	Steps            []CanaryStep        `gorm:"serializer:json;type:jsonb" json:"steps"`
+	Metrics          []CanaryMetric      `gorm:"serializer:json;type:jsonb" json:"metrics"`
+	SLOIDs           []uuid.UUID         `gorm:"column:slo_ids;serializer:json;type:jsonb" json:"sloIds"` // Must meet their objective over each analysis interval
+	AlertSeverity    AlertSeverity       `gorm:"size:20" json:"alertSeverity,omitempty"`                  // Alerts of the cluster at least this severe fail the analysis
+	AnalysisInterval int                 `gorm:"not null;default:60" json:"analysisInterval"`             // seconds
+	FailureLimit     int                 `gorm:"not null;default:0" json:"failureLimit"`                  // Failed analyses in a row tolerated
+	ProgressTimeout  int                 `gorm:"not null;default:600" json:"progressTimeout"`             // Seconds the canary has to become ready at each step
+	Status           CanaryRolloutStatus `gorm:"size:20;not null;index" json:"status"`
+	Step             int                 `gorm:"not null;default:0" json:"step"`   // Index of the current step
+	Weight           int                 `gorm:"not null;default:0" json:"weight"` // percent of traffic on the new image
+	StableReplicas   int32               `json:"stableReplicas"`
+	StableHash       string              `gorm:"size:63" json:"stableHash,omitempty"` // pod-template-hash of the stable pods
+	Failures         int                 `gorm:"not null;default:0" json:"failures"`  // Failed analyses in a row
+	Analyses         []CanaryAnalysis    `gorm:"serializer:json;type:jsonb" json:"analyses"`
+	Action           string              `gorm:"size:20" json:"action,omitempty"` // promote, promote_full or abort, waiting to be applied
+	ActionBy         string              `gorm:"size:255" json:"actionBy,omitempty"`
+	Message          string              `gorm:"type:text" json:"message,omitempty"`
+	CreatedBy        string              `gorm:"size:255" json:"createdBy,omitempty"`
+	StepStartedAt    *time.Time          `json:"stepStartedAt,omitempty"` // When the current step, or the promotion, began
+	ShiftedAt        *time.Time          `json:"shiftedAt,omitempty"`     // When traffic reached the current step's weight
+	LastAnalysisAt   *time.Time          `json:"lastAnalysisAt,omitempty"`
+	StartedAt        time.Time           `gorm:"not null" json:"startedAt"`
+	FinishedAt       *time.Time          `json:"finishedAt,omitempty"`
+	UpdatedAt        time.Time           `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// TableName specifies the table name for CanaryRollout
+func (CanaryRollout) TableName() string {
+	return "canary_rollouts"
+}
+
+// CreateCanaryRolloutRequest starts a rollout of an image to a deployment
+type CreateCanaryRolloutRequest struct {
+	ClusterID        uuid.UUID      `json:"clusterId"`
+	Namespace        string         `json:"namespace"`
+	Deployment       string         `json:"deployment"`
+	Container        string         `json:"container"` // The deployment's only container when empty
+	Image            string         `json:"image"`
+	Strategy         CanaryStrategy `json:"strategy"`
+	Traffic          CanaryTraffic  `json:"traffic"`
+	Service          string         `json:"service"`
+	Ingress          string         `json:"ingress"`
+	Steps            []CanaryStep   `json:"steps"` // 10, 25, 50 and 100% for five minutes each when empty; one 100% step for blue/green
+	Metrics          []CanaryMetric `json:"metrics"`
+	SLOIDs           []uuid.UUID    `json:"sloIds"`
+	AlertSeverity    AlertSeverity  `json:"alertSeverity"`
+	AnalysisInterval int            `json:"analysisInterval"` // 60 when zero
+	FailureLimit     int            `json:"failureLimit"`
+	ProgressTimeout  int            `json:"progressTimeout"` // 600 when zero
+}
+
+// CanaryActionRequest promotes or aborts a rollout. Promoting moves a paused
+// rollout on, or skips the rest of the current step; with Full it skips the
+// remaining steps too.
+type CanaryActionRequest struct {
+	Full bool `json:"full"`
+}
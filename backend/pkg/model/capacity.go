@@ -0,0 +1,73 @@
+// Package model provides data models for cluster capacity analysis
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RightsizingVerdict classifies a workload's requests against its observed usage
+type RightsizingVerdict string
+
+const (
+	RightsizingOverProvisioned  RightsizingVerdict = "over_provisioned"
+	RightsizingUnderProvisioned RightsizingVerdict = "under_provisioned"
+	RightsizingNoRequests       RightsizingVerdict = "no_requests"
+	RightsizingBalanced         RightsizingVerdict = "balanced"
+)
+
+// NamespaceCapacity compares the summed requests of a namespace with its observed usage
+type NamespaceCapacity struct {
+	Namespace          string  `json:"namespace"`
+	PodCount           int     `json:"podCount"`
+	CPURequestCores    float64 `json:"cpuRequestCores"`
+	CPUUsageCores      float64 `json:"cpuUsageCores"`
+	MemoryRequestBytes int64   `json:"memoryRequestBytes"`
+	MemoryUsageBytes   int64   `json:"memoryUsageBytes"`
+	CPUEfficiency      float64 `json:"cpuEfficiency"`    // usage / requests, percent
+	MemoryEfficiency   float64 `json:"memoryEfficiency"` // usage / requests, percent
+}
+
+// WorkloadRecommendation suggests per-pod requests for a workload based on its usage
+type WorkloadRecommendation struct {
+	Namespace                     string             `json:"namespace"`
+	Kind                          string             `json:"kind"`
+	Name                          string             `json:"name"`
+	Replicas                      int                `json:"replicas"`
+	CPUVerdict                    RightsizingVerdict `json:"cpuVerdict"`
+	MemoryVerdict                 RightsizingVerdict `json:"memoryVerdict"`
+	CPURequestCores               float64            `json:"cpuRequestCores"`
+	CPUAvgUsageCores              float64            `json:"cpuAvgUsageCores"`
+	CPUPeakUsageCores             float64            `json:"cpuPeakUsageCores"`
+	RecommendedCPURequestCores    float64            `json:"recommendedCpuRequestCores"`
+	MemoryRequestBytes            int64              `json:"memoryRequestBytes"`
+	MemoryAvgUsageBytes           int64              `json:"memoryAvgUsageBytes"`
+	MemoryPeakUsageBytes          int64              `json:"memoryPeakUsageBytes"`
+	RecommendedMemoryRequestBytes int64              `json:"recommendedMemoryRequestBytes"`
+}
+
+// NodeRunway projects when a node's usage reaches the capacity threshold
+type NodeRunway struct {
+	NodeName           string     `json:"nodeName"`
+	CPUUsagePercent    float64    `json:"cpuUsagePercent"`
+	MemoryUsagePercent float64    `json:"memoryUsagePercent"`
+	CPUGrowthPerDay    float64    `json:"cpuGrowthPerDay"`    // percentage points
+	MemoryGrowthPerDay float64    `json:"memoryGrowthPerDay"` // percentage points
+	CPURunwayDays      *float64   `json:"cpuRunwayDays,omitempty"`
+	MemoryRunwayDays   *float64   `json:"memoryRunwayDays,omitempty"`
+	ExhaustedAt        *time.Time `json:"exhaustedAt,omitempty"`
+	Samples            int        `json:"samples"`
+}
+
+// CapacityReport is the result of a capacity analysis of a cluster
+type CapacityReport struct {
+	ClusterID       uuid.UUID                `json:"clusterId"`
+	GeneratedAt     time.Time                `json:"generatedAt"`
+	WindowHours     int                      `json:"windowHours"`
+	ThresholdPct    float64                  `json:"thresholdPercent"`
+	Namespaces      []NamespaceCapacity      `json:"namespaces"`
+	Workloads       []WorkloadRecommendation `json:"workloads"`
+	Nodes           []NodeRunway             `json:"nodes"`
+	Recommendations []string                 `json:"recommendations"`
+}
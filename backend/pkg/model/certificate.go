@@ -0,0 +1,125 @@
+// Package model provides data models for certificate expiry monitoring
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CertificateSource is where a certificate in the inventory was found
+type CertificateSource string
+
+const (
+	CertificateSourceEndpoint   CertificateSource = "endpoint"   // A TLS endpoint the user monitors
+	CertificateSourceIngress    CertificateSource = "ingress"    // A TLS entry of a cluster ingress
+	CertificateSourceKubeconfig CertificateSource = "kubeconfig" // Embedded in a cluster's kubeconfig
+)
+
+// CertificateStatus is how close a certificate is to expiring
+type CertificateStatus string
+
+const (
+	CertificateStatusValid    CertificateStatus = "valid"
+	CertificateStatusWarning  CertificateStatus = "warning"  // within the warning threshold
+	CertificateStatusCritical CertificateStatus = "critical" // within the critical threshold
+	CertificateStatusExpired  CertificateStatus = "expired"
+	CertificateStatusError    CertificateStatus = "error"   // The certificate could not be read
+	CertificateStatusUnknown  CertificateStatus = "unknown" // Not checked yet
+)
+
+// Certificate is a TLS certificate in the inventory. Endpoint certificates are
+// added by users; ingress and kubeconfig certificates are discovered from the
+// clusters of their owner and removed when they disappear.
+type Certificate struct {
+	ID     uuid.UUID         `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID uuid.UUID         `json:"userId" gorm:"type:uuid;not null;uniqueIndex:idx_certificates_user_key"`
+	Source CertificateSource `json:"source" gorm:"type:varchar(20);not null;index"`
+	// Key identifies discovered certificates, e.g. ingress/<cluster>/<namespace>/<ingress>/<secret>
+	Key  string `json:"-" gorm:"type:varchar(1024);not null;uniqueIndex:idx_certificates_user_key"`
+	Name string `json:"name" gorm:"type:varchar(255);not null"`
+	// Where the certificate is served or stored
+	Host       string     `json:"host,omitempty" gorm:"type:varchar(255)"`
+	Port       int        `json:"port,omitempty"`
+	ServerName string     `json:"serverName,omitempty" gorm:"type:varchar(255)"` // SNI; the host when empty
+	ClusterID  *uuid.UUID `json:"clusterId,omitempty" gorm:"type:uuid;index"`
+	Namespace  string     `json:"namespace,omitempty" gorm:"type:varchar(255)"`
+	Resource   string     `json:"resource,omitempty" gorm:"type:varchar(255)"` // Ingress and secret, or kubeconfig context and role
+	// The certificate
+	Subject     string     `json:"subject,omitempty" gorm:"type:text"`
+	Issuer      string     `json:"issuer,omitempty" gorm:"type:text"`
+	DNSNames    string     `json:"dnsNames,omitempty" gorm:"type:text"` // Comma separated
+	Serial      string     `json:"serial,omitempty" gorm:"type:varchar(100)"`
+	Fingerprint string     `json:"fingerprint,omitempty" gorm:"type:varchar(64)"` // SHA-256 of the DER encoding
+	NotBefore   *time.Time `json:"notBefore,omitempty"`
+	NotAfter    *time.Time `json:"notAfter,omitempty" gorm:"index"`
+	VerifyError string     `json:"verifyError,omitempty" gorm:"type:text"` // Why endpoint certificates are not trusted
+	// Thresholds in days; 0 uses the certificates.expiry_warning and certificates.expiry_critical settings
+	WarningDays  int  `json:"warningDays,omitempty"`
+	CriticalDays int  `json:"criticalDays,omitempty"`
+	Enabled      bool `json:"enabled" gorm:"default:true"` // Disabled certificates are neither checked nor notified
+	// Last check
+	Status        CertificateStatus `json:"status" gorm:"type:varchar(20);not null;default:unknown;index"`
+	NotifiedLevel CertificateStatus `json:"-" gorm:"type:varchar(20)"` // Last status the owner was notified of
+	LastError     string            `json:"lastError,omitempty" gorm:"type:text"`
+	LastCheckedAt *time.Time        `json:"lastCheckedAt,omitempty"`
+	CreatedAt     time.Time         `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time         `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for Certificate
+func (Certificate) TableName() string {
+	return "certificates"
+}
+
+// CertificateResponse is a certificate with the time left until it expires
+type CertificateResponse struct {
+	Certificate
+	ExpiresIn *int64 `json:"expiresIn,omitempty"` // seconds; negative once expired
+}
+
+// Response adds the time left at now
+func (c *Certificate) Response(now time.Time) CertificateResponse {
+	resp := CertificateResponse{Certificate: *c}
+	if c.NotAfter != nil {
+		left := int64(c.NotAfter.Sub(now) / time.Second)
+		resp.ExpiresIn = &left
+	}
+	return resp
+}
+
+// CreateCertificateRequest is a request to monitor the certificate of a TLS endpoint
+type CreateCertificateRequest struct {
+	Name         string `json:"name,omitempty"` // host:port when omitted
+	Host         string `json:"host"`
+	Port         int    `json:"port,omitempty"` // 443 when omitted
+	ServerName   string `json:"serverName,omitempty"`
+	WarningDays  int    `json:"warningDays,omitempty"`
+	CriticalDays int    `json:"criticalDays,omitempty"`
+}
+
+// UpdateCertificateRequest changes the given fields of a certificate. Host, port
+// and server name only apply to endpoint certificates.
+type UpdateCertificateRequest struct {
+	Name         *string `json:"name,omitempty"`
+	Host         *string `json:"host,omitempty"`
+	Port         *int    `json:"port,omitempty"`
+	ServerName   *string `json:"serverName,omitempty"`
+	WarningDays  *int    `json:"warningDays,omitempty"`
+	CriticalDays *int    `json:"criticalDays,omitempty"`
+	Enabled      *bool   `json:"enabled,omitempty"`
+}
+
+// CertificateFilter selects certificates of the inventory
+type CertificateFilter struct {
+	UserID    uuid.UUID
+	Source    CertificateSource
+	Status    CertificateStatus
+	ClusterID *uuid.UUID
+	Search    string // Matches the name, host, subject and DNS names
+	Page      int
+	PageSize  int
+}
+
+// CertificateSummary counts the user's certificates by status
+type CertificateSummary map[CertificateStatus]int64
@@ -0,0 +1,87 @@
+// Package model provides data models for ChatOps: platform commands run from
+// Slack and Microsoft Teams
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChatProvider is the chat system an integration receives commands from
+type ChatProvider string
+
+const (
+	ChatProviderSlack ChatProvider = "slack" // Slash command and interactivity requests of a Slack app
+	ChatProviderTeams ChatProvider = "teams" // Outgoing webhook of a Teams team
+)
+
+// ChatOpsIntegration receives the signed commands of one Slack app or Teams
+// outgoing webhook. Commands run as the platform user the invoking chat user
+// linked their chat account to, with that user's permissions.
+type ChatOpsIntegration struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	UserID        uuid.UUID    `gorm:"type:uuid;not null;index:idx_chatops_integration_user_id" json:"userId"`
+	Name          string       `gorm:"size:255;not null" json:"name"`
+	Provider      ChatProvider `gorm:"size:20;not null" json:"provider"`
+	TeamID        string       `gorm:"size:255" json:"teamId,omitempty"` // Slack team ID or Teams tenant ID commands must come from; any when empty
+	SigningSecret string       `gorm:"type:text;not null" json:"-"`      // Slack signing secret, or Teams outgoing webhook security token
+	Enabled       bool         `gorm:"default:true" json:"enabled"`
+	LastCommandAt *time.Time   `json:"lastCommandAt,omitempty"`
+}
+
+// TableName specifies the table name for ChatOpsIntegration
+func (ChatOpsIntegration) TableName() string {
+	return "chatops_integrations"
+}
+
+// ChatUserLink maps a chat user of an integration to a platform user. The chat
+// user starts a link with a one-time code, which the platform user confirms
+// while signed in; UserID is empty until then.
+type ChatUserLink struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	IntegrationID  uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_chat_user_link_integration_user" json:"integrationId"`
+	ExternalUserID string     `gorm:"size:255;not null;uniqueIndex:idx_chat_user_link_integration_user" json:"externalUserId"` // Slack user ID, or Azure AD object ID in Teams
+	ExternalName   string     `gorm:"size:255" json:"externalName,omitempty"`
+	UserID         *uuid.UUID `gorm:"type:uuid;index" json:"userId,omitempty"`
+
+	LinkCodeHash      string     `gorm:"size:64;index" json:"-"` // SHA-256 of the pending link code
+	LinkCodeExpiresAt *time.Time `json:"-"`
+	LinkedAt          *time.Time `json:"linkedAt,omitempty"`
+
+	Integration *ChatOpsIntegration `gorm:"foreignKey:IntegrationID" json:"integration,omitempty"`
+}
+
+// TableName specifies the table name for ChatUserLink
+func (ChatUserLink) TableName() string {
+	return "chat_user_links"
+}
+
+// CreateChatOpsIntegrationRequest represents a request to create a ChatOps integration
+type CreateChatOpsIntegrationRequest struct {
+	Name          string       `json:"name"`
+	Provider      ChatProvider `json:"provider"`
+	TeamID        string       `json:"teamId,omitempty"`
+	SigningSecret string       `json:"signingSecret"`
+	Enabled       *bool        `json:"enabled,omitempty"`
+}
+
+// UpdateChatOpsIntegrationRequest represents a request to update a ChatOps integration
+type UpdateChatOpsIntegrationRequest struct {
+	Name          *string `json:"name,omitempty"`
+	TeamID        *string `json:"teamId,omitempty"`
+	SigningSecret *string `json:"signingSecret,omitempty"`
+	Enabled       *bool   `json:"enabled,omitempty"`
+}
+
+// ConfirmChatLinkRequest represents a request to link the chat account that
+// asked for the code to the signed-in user
+type ConfirmChatLinkRequest struct {
+	Code string `json:"code"`
+}
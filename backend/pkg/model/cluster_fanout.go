@@ -0,0 +1,76 @@
+// Package model provides data models for queries fanned out across clusters
+package model
+
+import (
+	"github.com/google/uuid"
+)
+
+// FanoutResource is what a fan-out query lists from each cluster
+type FanoutResource string
+
+const (
+	FanoutResourcePods        FanoutResource = "pods"
+	FanoutResourceDeployments FanoutResource = "deployments"
+	FanoutResourceServices    FanoutResource = "services"
+	FanoutResourceNodes       FanoutResource = "nodes"
+	FanoutResourceMetrics     FanoutResource = "metrics" // Live usage of each cluster
+	FanoutResourceImages      FanoutResource = "images"  // Container images of deployments and pods
+)
+
+// ClusterFanoutStatus is the outcome of a fan-out query on one cluster
+type ClusterFanoutStatus string
+
+const (
+	ClusterFanoutOK      ClusterFanoutStatus = "ok"
+	ClusterFanoutError   ClusterFanoutStatus = "error"
+	ClusterFanoutTimeout ClusterFanoutStatus = "timeout"
+)
+
+// ClusterFanoutRequest represents a query run across several clusters in parallel
+type ClusterFanoutRequest struct {
+	ClusterIDs []uuid.UUID         `json:"clusterIds"` // Every cluster the user can see when empty
+	Resource   FanoutResource      `json:"resource"`
+	Namespace  string              `json:"namespace"` // All namespaces when empty
+	Filter     ClusterFanoutFilter `json:"filter"`
+	SortBy     string              `json:"sortBy"`  // name (default) or restarts
+	Timeout    int                 `json:"timeout"` // Seconds allowed per cluster, 15 by default
+	Limit      int                 `json:"limit"`   // Items returned, 1000 by default
+}
+
+// ClusterFanoutFilter narrows the items a fan-out query returns
+type ClusterFanoutFilter struct {
+	Name        string `json:"name"`        // Case-insensitive substring of the item name
+	Status      string `json:"status"`      // Pod status or phase, or node status
+	MinRestarts int32  `json:"minRestarts"` // Pods restarted at least this often
+	NotReady    bool   `json:"notReady"`    // Unready pods and nodes, and deployments missing ready replicas
+}
+
+// ClusterFanoutItem is an item of a fan-out query attributed to its cluster
+type ClusterFanoutItem struct {
+	ClusterID   uuid.UUID   `json:"clusterId"`
+	ClusterName string      `json:"clusterName"`
+	Namespace   string      `json:"namespace,omitempty"`
+	Name        string      `json:"name"`
+	Object      interface{} `json:"object"`
+}
+
+// ClusterFanoutResult reports how the query went on one cluster
+type ClusterFanoutResult struct {
+	ClusterID   uuid.UUID           `json:"clusterId"`
+	ClusterName string              `json:"clusterName"`
+	Status      ClusterFanoutStatus `json:"status"`
+	Error       string              `json:"error,omitempty"`
+	Count       int                 `json:"count"`    // Matching items, before the limit
+	Duration    int64               `json:"duration"` // Milliseconds
+}
+
+// ClusterFanoutResponse is the merged result of a fan-out query. Clusters that failed
+// or timed out are reported in Clusters; the items of the others are still returned.
+type ClusterFanoutResponse struct {
+	Resource  FanoutResource        `json:"resource"`
+	Items     []ClusterFanoutItem   `json:"items"`
+	Total     int                   `json:"total"` // Matching items across clusters, before the limit
+	Truncated bool                  `json:"truncated"`
+	Clusters  []ClusterFanoutResult `json:"clusters"`
+	Failed    int                   `json:"failed"` // Clusters that failed or timed out
+}
@@ -21,6 +21,12 @@ type ClusterMetric struct {
 	FailedPodCount  int32     `json:"failedPodCount" gorm:"type:int"`
 	NodeCount       int32     `json:"nodeCount" gorm:"type:int"`
 	ReadyNodeCount  int32     `json:"readyNodeCount" gorm:"type:int"`
+	// Object states from kube-state-metrics (zero when it is not installed)
+	KubeStateAvailable         bool  `json:"kubeStateAvailable" gorm:"type:boolean;default:false"`
+	DeploymentCount            int32 `json:"deploymentCount" gorm:"type:int"`
+	UnavailableDeploymentCount int32 `json:"unavailableDeploymentCount" gorm:"type:int"`
+	CrashLoopPodCount          int32 `json:"crashLoopPodCount" gorm:"type:int"`
+	FailedJobCount             int32 `json:"failedJobCount" gorm:"type:int"`
 	CreatedAt       time.Time `json:"createdAt" gorm:"autoCreateTime"`
 }
 
@@ -56,6 +62,10 @@ type PodMetric struct {
 	Status          string    `json:"status" gorm:"type:varchar(20)"`
 	Ready           bool      `json:"ready" gorm:"type:boolean"`
 	NodeName        string    `json:"nodeName" gorm:"type:varchar(255)"`
+	// Requests and labels at collection time, used for cost attribution
+	CPURequestCores    float64 `json:"cpuRequestCores" gorm:"type:decimal(10,4)"`
+	MemoryRequestBytes int64   `json:"memoryRequestBytes" gorm:"type:bigint"`
+	Labels             string  `json:"labels,omitempty" gorm:"type:text"` // JSON object
 	CreatedAt       time.Time `json:"createdAt" gorm:"autoCreateTime"`
 }
 
@@ -70,6 +80,11 @@ type ClusterMetricSummary struct {
 	FailedPodCount  int32   `json:"failedPodCount"`
 	NodeCount       int32   `json:"nodeCount"`
 	ReadyNodeCount  int32   `json:"readyNodeCount"`
+	KubeStateAvailable         bool  `json:"kubeStateAvailable"`
+	DeploymentCount            int32 `json:"deploymentCount"`
+	UnavailableDeploymentCount int32 `json:"unavailableDeploymentCount"`
+	CrashLoopPodCount          int32 `json:"crashLoopPodCount"`
+	FailedJobCount             int32 `json:"failedJobCount"`
 }
 
 // NodeMetricSummary represents aggregated node metrics
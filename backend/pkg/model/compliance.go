@@ -0,0 +1,205 @@
+// Package model provides data models for compliance benchmark checks
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AgentCommandComplianceScan runs host compliance probes through the agent
+const AgentCommandComplianceScan AgentCommandType = "compliance_scan"
+
+// ComplianceTargetType is what a compliance scan inspects
+type ComplianceTargetType string
+
+const (
+	ComplianceTargetHost    ComplianceTargetType = "host"
+	ComplianceTargetCluster ComplianceTargetType = "cluster"
+)
+
+// ComplianceCheckStatus is the outcome of one check
+type ComplianceCheckStatus string
+
+const (
+	CompliancePass    ComplianceCheckStatus = "pass"
+	ComplianceFail    ComplianceCheckStatus = "fail"
+	ComplianceSkipped ComplianceCheckStatus = "skipped" // Not applicable to the target
+	ComplianceError   ComplianceCheckStatus = "error"   // Could not be evaluated
+)
+
+// Compliance check severities
+const (
+	ComplianceSeverityLow    = "low"
+	ComplianceSeverityMedium = "medium"
+	ComplianceSeverityHigh   = "high"
+)
+
+// ComplianceReportStatus is the state of a compliance scan
+type ComplianceReportStatus string
+
+const (
+	ComplianceReportRunning   ComplianceReportStatus = "running"
+	ComplianceReportCompleted ComplianceReportStatus = "completed"
+	ComplianceReportFailed    ComplianceReportStatus = "failed" // The target could not be scanned at all
+)
+
+// ComplianceCheck describes a benchmark check
+type ComplianceCheck struct {
+	ID          string               `json:"id"`        // e.g. host.ssh.permit_root_login
+	Benchmark   string               `json:"benchmark"` // e.g. CIS Linux 5.2.10
+	Title       string               `json:"title"`
+	Severity    string               `json:"severity"`
+	TargetType  ComplianceTargetType `json:"targetType"`
+	Remediation string               `json:"remediation"`
+}
+
+// ComplianceCheckResult is the outcome of a check in a report
+type ComplianceCheckResult struct {
+	ComplianceCheck
+	Status   ComplianceCheckStatus `json:"status"`
+	Evidence string                `json:"evidence"`
+}
+
+// ComplianceHostProbe tells an agent how to evaluate a host check
+type ComplianceHostProbe struct {
+	ID       string   `json:"id"`
+	Kind     string   `json:"kind"`               // sshd, file or sysctl
+	Key      string   `json:"key,omitempty"`      // sshd option or kernel parameter
+	Expected []string `json:"expected,omitempty"` // Accepted values, case-insensitive
+	Default  string   `json:"default,omitempty"`  // sshd value when the option is not set
+	Max      *int     `json:"max,omitempty"`      // Highest accepted numeric sshd value
+	Path     string   `json:"path,omitempty"`     // file to check
+	MaxMode  string   `json:"maxMode,omitempty"`  // Most permissive file mode, e.g. 0644
+	Owner    string   `json:"owner,omitempty"`    // Required file owner
+	Groups   []string `json:"groups,omitempty"`   // Accepted file groups
+}
+
+// ComplianceProbeResult is what an agent reports for a probe
+type ComplianceProbeResult struct {
+	ID       string                `json:"id"`
+	Status   ComplianceCheckStatus `json:"status"`
+	Evidence string                `json:"evidence"`
+}
+
+// ComplianceReport is the result of scanning one host or cluster. Score is the
+// share of evaluated checks that passed, from 0 to 100.
+type ComplianceReport struct {
+	ID          uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	TargetType  ComplianceTargetType   `json:"targetType" gorm:"type:varchar(20);not null;index:idx_compliance_reports_target"`
+	TargetID    uuid.UUID              `json:"targetId" gorm:"type:uuid;not null;index:idx_compliance_reports_target"`
+	TargetName  string                 `json:"targetName" gorm:"type:varchar(255)"`
+	ScheduleID  *uuid.UUID             `json:"scheduleId,omitempty" gorm:"type:uuid;index"`
+	TriggeredBy *uuid.UUID             `json:"triggeredBy,omitempty" gorm:"type:uuid"` // Empty for scheduled scans
+	Status      ComplianceReportStatus `json:"status" gorm:"type:varchar(20);not null"`
+	Score       float64                `json:"score"`
+	Passed      int                    `json:"passed"`
+	Failed      int                    `json:"failed"`
+	Skipped     int                    `json:"skipped"`
+	Errors      int                    `json:"errors"`
+	Results     string                 `json:"-" gorm:"type:jsonb"` // JSON array of ComplianceCheckResult
+	Error       string                 `json:"error,omitempty" gorm:"type:text"`
+	StartedAt   time.Time              `json:"startedAt"`
+	CompletedAt *time.Time             `json:"completedAt,omitempty"`
+	CreatedAt   time.Time              `json:"createdAt" gorm:"autoCreateTime;index"`
+}
+
+// TableName specifies the table name for ComplianceReport
+func (ComplianceReport) TableName() string {
+	return "compliance_reports"
+}
+
+// ComplianceReportResponse is a report with its check results
+type ComplianceReportResponse struct {
+	ComplianceReport
+	Results []ComplianceCheckResult `json:"results"`
+}
+
+// Response decodes the report's check results
+func (r *ComplianceReport) Response() ComplianceReportResponse {
+	resp := ComplianceReportResponse{ComplianceReport: *r, Results: []ComplianceCheckResult{}}
+	if r.Results != "" {
+		json.Unmarshal([]byte(r.Results), &resp.Results)
+	}
+	return resp
+}
+
+// ComplianceSchedule scans hosts or clusters periodically
+type ComplianceSchedule struct {
+	ID         uuid.UUID            `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	Name       string               `json:"name" gorm:"type:varchar(255);not null;uniqueIndex"`
+	TargetType ComplianceTargetType `json:"targetType" gorm:"type:varchar(20);not null"`
+	TargetIDs  string               `json:"-" gorm:"type:jsonb"`      // JSON array; every target of the type when empty
+	Interval   int                  `json:"interval" gorm:"not null"` // seconds
+	Enabled    bool                 `json:"enabled" gorm:"default:true"`
+	CreatedBy  uuid.UUID            `json:"createdBy" gorm:"type:uuid;not null"`
+	LastRunAt  *time.Time           `json:"lastRunAt,omitempty"`
+	NextRunAt  time.Time            `json:"nextRunAt" gorm:"not null;index"`
+	CreatedAt  time.Time            `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time            `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for ComplianceSchedule
+func (ComplianceSchedule) TableName() string {
+	return "compliance_schedules"
+}
+
+// ComplianceScheduleResponse is a schedule with its targets decoded
+type ComplianceScheduleResponse struct {
+	ComplianceSchedule
+	TargetIDs []uuid.UUID `json:"targetIds"`
+}
+
+// Response decodes the schedule's targets
+func (s *ComplianceSchedule) Response() ComplianceScheduleResponse {
+	resp := ComplianceScheduleResponse{ComplianceSchedule: *s, TargetIDs: []uuid.UUID{}}
+	if s.TargetIDs != "" {
+		json.Unmarshal([]byte(s.TargetIDs), &resp.TargetIDs)
+	}
+	return resp
+}
+
+// RunComplianceScanRequest is a request to scan one host or cluster now
+type RunComplianceScanRequest struct {
+	TargetType ComplianceTargetType `json:"targetType"`
+	TargetID   uuid.UUID            `json:"targetId"`
+}
+
+// CreateComplianceScheduleRequest is a request to scan targets periodically
+type CreateComplianceScheduleRequest struct {
+	Name       string               `json:"name"`
+	TargetType ComplianceTargetType `json:"targetType"`
+	TargetIDs  []uuid.UUID          `json:"targetIds,omitempty"` // Every target of the type when empty
+	Interval   int                  `json:"interval"`            // seconds
+	Enabled    *bool                `json:"enabled,omitempty"`   // true when omitted
+}
+
+// UpdateComplianceScheduleRequest changes the given fields of a schedule
+type UpdateComplianceScheduleRequest struct {
+	Name      *string      `json:"name,omitempty"`
+	TargetIDs *[]uuid.UUID `json:"targetIds,omitempty"`
+	Interval  *int         `json:"interval,omitempty"`
+	Enabled   *bool        `json:"enabled,omitempty"`
+}
+
+// ComplianceReportFilter selects compliance reports
+type ComplianceReportFilter struct {
+	TargetType ComplianceTargetType
+	TargetID   *uuid.UUID
+	ScheduleID *uuid.UUID
+	Status     ComplianceReportStatus
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
+
+// ComplianceTrendPoint is the score of one completed scan of a target
+type ComplianceTrendPoint struct {
+	ReportID  uuid.UUID `json:"reportId"`
+	Timestamp time.Time `json:"timestamp"`
+	Score     float64   `json:"score"`
+	Passed    int       `json:"passed"`
+	Failed    int       `json:"failed"`
+}
@@ -0,0 +1,118 @@
+// Package model provides data models for cluster cost attribution
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CostBasis selects which resource quantity is charged
+type CostBasis string
+
+const (
+	CostBasisRequests CostBasis = "requests" // charge reserved capacity
+	CostBasisUsage    CostBasis = "usage"    // charge observed usage
+	CostBasisMax      CostBasis = "max"      // charge the larger of requests and usage
+)
+
+// IsValid reports whether the basis is supported
+func (b CostBasis) IsValid() bool {
+	switch b {
+	case CostBasisRequests, CostBasisUsage, CostBasisMax:
+		return true
+	}
+	return false
+}
+
+// PriceSheetEntry overrides the default rates for nodes of one instance type
+type PriceSheetEntry struct {
+	InstanceType    string  `json:"instanceType"`
+	CPUHourly       float64 `json:"cpuHourly"`
+	MemoryGiBHourly float64 `json:"memoryGibHourly"`
+}
+
+// ClusterPricing represents the pricing configured for a cluster
+type ClusterPricing struct {
+	ID              uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	ClusterID       uuid.UUID `json:"clusterId" gorm:"type:uuid;not null;uniqueIndex"`
+	CPUHourly       float64   `json:"cpuHourly" gorm:"type:decimal(12,6);not null"`       // per vCPU-hour
+	MemoryGiBHourly float64   `json:"memoryGibHourly" gorm:"type:decimal(12,6);not null"` // per GiB-hour
+	Currency        string    `json:"currency" gorm:"type:varchar(3);not null;default:'USD'"`
+	Basis           CostBasis `json:"basis" gorm:"type:varchar(20);not null;default:'requests'"`
+	PriceSheet      string    `json:"priceSheet,omitempty" gorm:"type:text"` // JSON array of PriceSheetEntry
+	CreatedAt       time.Time `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for ClusterPricing
+func (ClusterPricing) TableName() string {
+	return "cluster_pricing"
+}
+
+// UpdateClusterPricingRequest represents a request to configure cluster pricing
+type UpdateClusterPricingRequest struct {
+	CPUHourly       float64           `json:"cpuHourly"`
+	MemoryGiBHourly float64           `json:"memoryGibHourly"`
+	Currency        string            `json:"currency"`
+	Basis           CostBasis         `json:"basis"`
+	PriceSheet      []PriceSheetEntry `json:"priceSheet"`
+}
+
+// ClusterCostDaily is a per-namespace daily cost rollup kept beyond metrics retention
+type ClusterCostDaily struct {
+	ID             uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	ClusterID      uuid.UUID `json:"clusterId" gorm:"type:uuid;not null;index:idx_cluster_cost_daily,sort:ordered"`
+	Day            time.Time `json:"day" gorm:"type:date;not null;index:idx_cluster_cost_daily,sort:ordered"`
+	Namespace      string    `json:"namespace" gorm:"type:varchar(255);not null"`
+	CPUCoreHours   float64   `json:"cpuCoreHours" gorm:"type:decimal(14,4)"`
+	MemoryGiBHours float64   `json:"memoryGibHours" gorm:"type:decimal(14,4)"`
+	CPUCost        float64   `json:"cpuCost" gorm:"type:decimal(14,4)"`
+	MemoryCost     float64   `json:"memoryCost" gorm:"type:decimal(14,4)"`
+	Currency       string    `json:"currency" gorm:"type:varchar(3)"`
+	CreatedAt      time.Time `json:"createdAt" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for ClusterCostDaily
+func (ClusterCostDaily) TableName() string {
+	return "cluster_cost_daily"
+}
+
+// CostAllocation is the cost attributed to one group of pods
+type CostAllocation struct {
+	Group          string  `json:"group"`
+	PodCount       int     `json:"podCount"`
+	CPUCoreHours   float64 `json:"cpuCoreHours"`
+	MemoryGiBHours float64 `json:"memoryGibHours"`
+	CPUCost        float64 `json:"cpuCost"`
+	MemoryCost     float64 `json:"memoryCost"`
+	TotalCost      float64 `json:"totalCost"`
+}
+
+// CostReport represents the cost attribution of a cluster over a time range
+type CostReport struct {
+	ClusterID   uuid.UUID        `json:"clusterId"`
+	Start       time.Time        `json:"start"`
+	End         time.Time        `json:"end"`
+	GroupBy     string           `json:"groupBy"` // namespace or label:<key>
+	Basis       CostBasis        `json:"basis"`
+	Currency    string           `json:"currency"`
+	TotalCost   float64          `json:"totalCost"`
+	Allocations []CostAllocation `json:"allocations"`
+}
+
+// CostTrendPoint is the cost of a cluster in one calendar month
+type CostTrendPoint struct {
+	Month      string           `json:"month"` // YYYY-MM
+	CPUCost    float64          `json:"cpuCost"`
+	MemoryCost float64          `json:"memoryCost"`
+	TotalCost  float64          `json:"totalCost"`
+	Namespaces []CostAllocation `json:"namespaces"`
+}
+
+// CostTrendReport represents monthly cost totals of a cluster
+type CostTrendReport struct {
+	ClusterID uuid.UUID        `json:"clusterId"`
+	Currency  string           `json:"currency"`
+	Months    []CostTrendPoint `json:"months"`
+}
@@ -0,0 +1,60 @@
+// Package model provides data models for host crontabs and systemd timers
+package model
+
+// Agent command types for scheduled job management
+const (
+	AgentCommandCrontabRead     AgentCommandType = "crontab_read"
+	AgentCommandCrontabWrite    AgentCommandType = "crontab_write"
+	AgentCommandTimerList       AgentCommandType = "timer_list"
+	AgentCommandCalendarPreview AgentCommandType = "calendar_preview"
+)
+
+// CrontabEntry represents a single job line in a user's crontab
+type CrontabEntry struct {
+	ID       string `json:"id"` // Derived from the line content; changes when the entry changes
+	Line     int    `json:"line"`
+	Schedule string `json:"schedule"`
+	Command  string `json:"command"`
+	Disabled bool   `json:"disabled"` // Commented out with "#"
+}
+
+// SystemdTimer represents a systemd timer unit on a host
+type SystemdTimer struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	ActiveState string `json:"activeState"`
+	Unit        string `json:"unit,omitempty"`     // Unit activated by the timer
+	Calendar    string `json:"calendar,omitempty"` // OnCalendar expressions
+	NextElapse  string `json:"nextElapse,omitempty"`
+	LastTrigger string `json:"lastTrigger,omitempty"`
+}
+
+// CrontabResponse represents the scheduled jobs of a host
+type CrontabResponse struct {
+	User    string         `json:"user"`
+	Entries []CrontabEntry `json:"entries"`
+	Timers  []SystemdTimer `json:"timers"`
+}
+
+// CrontabEntryRequest represents a request to create or update a crontab entry
+type CrontabEntryRequest struct {
+	User     string `json:"user"` // Defaults to root
+	Schedule string `json:"schedule" binding:"required"`
+	Command  string `json:"command" binding:"required"`
+	Disabled bool   `json:"disabled"`
+	DryRun   bool   `json:"dryRun"` // Validate and preview without writing the crontab
+}
+
+// ValidateScheduleRequest represents a request to validate a cron schedule or an
+// OnCalendar expression. Exactly one of the two must be set.
+type ValidateScheduleRequest struct {
+	Schedule string `json:"schedule,omitempty"`
+	Calendar string `json:"calendar,omitempty"`
+}
+
+// ScheduleValidationResponse represents the result of validating a schedule
+type ScheduleValidationResponse struct {
+	Valid          bool     `json:"valid"`
+	Error          string   `json:"error,omitempty"`
+	NextExecutions []string `json:"nextExecutions"`
+}
@@ -0,0 +1,158 @@
+// Package model provides Prometheus dashboard rendering models
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PrometheusDashboardConfig is the part of a dashboard's Config the backend
+// evaluates and lays out. Other keys are left to the frontend.
+type PrometheusDashboardConfig struct {
+	DataSourceID *uuid.UUID                    `json:"dataSourceId,omitempty"` // Default for panels that do not name one
+	Variables    []PrometheusDashboardVariable `json:"variables,omitempty"`
+	Panels       []PrometheusDashboardPanel    `json:"panels"`
+
+	AnnotationFilter *DashboardAnnotationFilter `json:"annotationFilter,omitempty"`
+}
+
+// PrometheusDashboardVariable is a template variable. Queries refer to it as $name,
+// ${name} or [[name]] and get its current value when rendered. The query of a
+// query variable may refer to the variables before it.
+type PrometheusDashboardVariable struct {
+	Name       string   `json:"name"`
+	Label      string   `json:"label,omitempty"`
+	Type       string   `json:"type"`            // query, custom, constant, textbox or interval
+	Query      string   `json:"query,omitempty"` // label_values(label), label_values(selector, label), label_names(), metrics(regex) or query_result(expr)
+	Current    string   `json:"current"`         // A regex alternation for several values; the first option when empty
+	Options    []string `json:"options,omitempty"`
+	Multi      bool     `json:"multi,omitempty"`
+	IncludeAll bool     `json:"includeAll,omitempty"`
+	AllValue   string   `json:"allValue,omitempty"` // Value of All; .* by default
+	Regex      string   `json:"regex,omitempty"`    // Filters the options; its first group, if any, is the option
+}
+
+// Dashboard variable types
+const (
+	DashboardVariableQuery    = "query"
+	DashboardVariableCustom   = "custom"
+	DashboardVariableConstant = "constant"
+	DashboardVariableTextbox  = "textbox"
+	DashboardVariableInterval = "interval"
+
+	// DashboardVariableAll selects every option of a variable with IncludeAll
+	DashboardVariableAll = "$__all"
+)
+
+// PrometheusDashboardPanel is a panel and the queries it plots
+type PrometheusDashboardPanel struct {
+	ID           DashboardPanelID            `json:"id"`
+	Title        string                      `json:"title,omitempty"`
+	Description  string                      `json:"description,omitempty"`
+	Type         string                      `json:"type,omitempty"`
+	DataSourceID *uuid.UUID                  `json:"dataSourceId,omitempty"`
+	GridPos      *DashboardGridPos           `json:"gridPos,omitempty"`
+	Targets      []PrometheusDashboardTarget `json:"targets"`
+
+	// Repeat renders the panel once per selected value of the variable, h(orizontally)
+	// or v(ertically) from its position
+	Repeat          string `json:"repeat,omitempty"`
+	RepeatDirection string `json:"repeatDirection,omitempty"`
+}
+
+// DashboardGridPos places a panel on a 24 column grid
+type DashboardGridPos struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// PrometheusDashboardTarget is one PromQL query of a panel, written as Expr or
+// built from Builder
+type PrometheusDashboardTarget struct {
+	RefID        string       `json:"refId,omitempty"`
+	Expr         string       `json:"expr"`
+	Builder      *PromQLQuery `json:"builder,omitempty"`      // Used when Expr is empty
+	LegendFormat string       `json:"legendFormat,omitempty"` // e.g. "{{pod}}"
+	Hide         bool         `json:"hide,omitempty"`
+}
+
+// DashboardPanelID is a panel ID, which dashboards imported from Grafana give as a number
+type DashboardPanelID string
+
+// UnmarshalJSON accepts a string or a number
+func (id *DashboardPanelID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = DashboardPanelID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*id = DashboardPanelID(strings.TrimSpace(n.String()))
+	return nil
+}
+
+// DashboardRenderRequest is the time range to render a dashboard over
+type DashboardRenderRequest struct {
+	Start     time.Time
+	End       time.Time
+	Step      string            // Go duration; chosen from the range when empty
+	PanelID   string            // Renders only this panel when set
+	Variables map[string]string // Overrides the current values of template variables
+}
+
+// DashboardRenderResult is the data of a dashboard's panels. Every series has one
+// value per timestamp, null where the query returned no sample.
+type DashboardRenderResult struct {
+	DashboardID uuid.UUID              `json:"dashboardId"`
+	Start       time.Time              `json:"start"`
+	End         time.Time              `json:"end"`
+	Step        string                 `json:"step"`
+	Timestamps  []time.Time            `json:"timestamps"`
+	Panels      []DashboardPanelResult `json:"panels"`
+	Annotations []DashboardAnnotation  `json:"annotations"` // Overlapping the range, oldest first
+}
+
+// DashboardPanelResult is the data of one panel. A failed query is reported in
+// Error without failing the other panels. Each copy of a repeated panel is a
+// result of its own, with the value it was rendered for.
+type DashboardPanelResult struct {
+	ID           string                 `json:"id"`
+	Title        string                 `json:"title,omitempty"`
+	Type         string                 `json:"type,omitempty"`
+	GridPos      *DashboardGridPos      `json:"gridPos,omitempty"`
+	Repeat       string                 `json:"repeat,omitempty"`
+	RepeatValue  string                 `json:"repeatValue,omitempty"`
+	DataSourceID *uuid.UUID             `json:"dataSourceId,omitempty"`
+	Series       []DashboardPanelSeries `json:"series"`
+	Error        string                 `json:"error,omitempty"`
+	Warnings     []string               `json:"warnings,omitempty"` // e.g. a Thanos partial response
+}
+
+// DashboardPanelSeries is one series returned by a panel query
+type DashboardPanelSeries struct {
+	RefID  string            `json:"refId,omitempty"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Values []*float64        `json:"values"`
+}
+
+// DashboardVariableResult is a template variable with its options resolved
+// against the dashboard's data source and the variables before it
+type DashboardVariableResult struct {
+	Name       string   `json:"name"`
+	Label      string   `json:"label,omitempty"`
+	Type       string   `json:"type"`
+	Current    string   `json:"current"`
+	Options    []string `json:"options"`
+	Multi      bool     `json:"multi,omitempty"`
+	IncludeAll bool     `json:"includeAll,omitempty"`
+	Error      string   `json:"error,omitempty"` // Why the options could not be resolved
+}
@@ -0,0 +1,105 @@
+// Package model provides public dashboard share link models
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DashboardShareLink is an expiring, tokenized link that shows a Prometheus
+// dashboard read-only without logging in. A live link renders the dashboard over
+// the last Range when opened; a frozen one always shows the data captured when it
+// was created. Only a hash of the token is stored.
+type DashboardShareLink struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	DashboardID    uuid.UUID  `gorm:"type:uuid;not null;index:idx_dashboard_share_link_dashboard_id" json:"dashboardId"`
+	CreatedBy      uuid.UUID  `gorm:"type:uuid;not null" json:"createdBy"`
+	Name           string     `gorm:"size:255" json:"name,omitempty"`
+	TokenHash      string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Range          int64      `gorm:"not null" json:"range"` // seconds
+	Step           string     `gorm:"size:20" json:"step,omitempty"`
+	Frozen         bool       `gorm:"default:false" json:"frozen"`
+	Snapshot       string     `gorm:"type:text" json:"-"` // JSON: DashboardRenderResult of a frozen link
+	SnapshotAt     *time.Time `json:"snapshotAt,omitempty"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expiresAt"`
+	RevokedAt      *time.Time `json:"revokedAt,omitempty"`
+	AccessCount    int64      `gorm:"default:0" json:"accessCount"`
+	LastAccessedAt *time.Time `json:"lastAccessedAt,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	Status         string     `gorm:"-" json:"status"`
+}
+
+// TableName specifies the table name for DashboardShareLink
+func (DashboardShareLink) TableName() string {
+	return "dashboard_share_links"
+}
+
+// Share link statuses
+const (
+	ShareLinkStatusActive  = "active"
+	ShareLinkStatusExpired = "expired"
+	ShareLinkStatusRevoked = "revoked"
+)
+
+// StatusAt returns the status of the link at now
+func (l *DashboardShareLink) StatusAt(now time.Time) string {
+	switch {
+	case l.RevokedAt != nil:
+		return ShareLinkStatusRevoked
+	case !l.ExpiresAt.After(now):
+		return ShareLinkStatusExpired
+	}
+	return ShareLinkStatusActive
+}
+
+// DashboardShareLinkAccess records an attempt to open a share link
+type DashboardShareLinkAccess struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	LinkID    uuid.UUID `gorm:"type:uuid;not null;index:idx_dashboard_share_link_access_link_id" json:"linkId"`
+	Outcome   string    `gorm:"size:20;not null" json:"outcome"`
+	IPAddress string    `gorm:"size:50" json:"ipAddress"`
+	UserAgent string    `gorm:"type:text" json:"userAgent,omitempty"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// TableName specifies the table name for DashboardShareLinkAccess
+func (DashboardShareLinkAccess) TableName() string {
+	return "dashboard_share_link_accesses"
+}
+
+// Share link access outcomes
+const (
+	ShareLinkAccessServed      = "served"
+	ShareLinkAccessExpired     = "expired"
+	ShareLinkAccessRevoked     = "revoked"
+	ShareLinkAccessRateLimited = "rate_limited"
+	ShareLinkAccessFailed      = "failed"
+)
+
+// CreateDashboardShareLinkRequest is a request to share a dashboard
+type CreateDashboardShareLinkRequest struct {
+	Name      string `json:"name"`
+	ExpiresIn string `json:"expiresIn"` // Go duration; the share link TTL setting when empty
+	Range     string `json:"range"`     // Go duration shown by the link, ending when it is opened or frozen
+	Step      string `json:"step"`
+	Frozen    bool   `json:"frozen"` // Capture the data now instead of querying on each view
+}
+
+// DashboardShareLinkResult is a created share link. The token is only returned here.
+type DashboardShareLinkResult struct {
+	Link  *DashboardShareLink `json:"link"`
+	Token string              `json:"token"`
+	URL   string              `json:"url"`
+}
+
+// SharedDashboard is what a share link shows
+type SharedDashboard struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Config      string                 `json:"config"`
+	RefreshRate int                    `json:"refreshRate,omitempty"` // 0 for a frozen link
+	Frozen      bool                   `json:"frozen"`
+	ExpiresAt   time.Time              `json:"expiresAt"`
+	Data        *DashboardRenderResult `json:"data"`
+}
@@ -0,0 +1,83 @@
+// Package model provides data models for raw data exports
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// DataExportDataset is the data an export contains
+type DataExportDataset string
+
+const (
+	DataExportHosts          DataExportDataset = "hosts"           // Host inventory
+	DataExportHostMetrics    DataExportDataset = "host_metrics"    // Utilization samples agents reported
+	DataExportClusterMetrics DataExportDataset = "cluster_metrics" // Cluster metric snapshots
+	DataExportAlerts         DataExportDataset = "alerts"          // Alert history of the requesting user
+)
+
+// DataExportFormat is the file format of an export
+type DataExportFormat string
+
+const (
+	DataExportFormatCSV     DataExportFormat = "csv"
+	DataExportFormatParquet DataExportFormat = "parquet"
+)
+
+// DataExportStatus is the state of an export
+type DataExportStatus string
+
+const (
+	DataExportStatusPending   DataExportStatus = "pending" // Queued for generation
+	DataExportStatusCompleted DataExportStatus = "completed"
+	DataExportStatusFailed    DataExportStatus = "failed"
+)
+
+// DataExport is a file of raw data generated by the job queue. Completed
+// exports are downloaded through signed links until they expire.
+type DataExport struct {
+	ID          uuid.UUID         `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID         `json:"userId" gorm:"type:uuid;not null;index"`
+	Dataset     DataExportDataset `json:"dataset" gorm:"type:varchar(50);not null"`
+	Format      DataExportFormat  `json:"format" gorm:"type:varchar(10);not null"`
+	From        *time.Time        `json:"from,omitempty" gorm:"column:from_time"` // Time-series datasets only
+	To          *time.Time        `json:"to,omitempty" gorm:"column:to_time"`
+	ClusterID   *uuid.UUID        `json:"clusterId,omitempty" gorm:"type:uuid"`
+	HostIDs     pq.StringArray    `json:"hostIds,omitempty" gorm:"type:text[]"`
+	Status      DataExportStatus  `json:"status" gorm:"type:varchar(20);not null"`
+	Rows        int64             `json:"rows"`
+	SizeBytes   int64             `json:"sizeBytes"`
+	Error       string            `json:"error,omitempty" gorm:"type:text"`
+	Data        []byte            `json:"-" gorm:"type:bytea"`
+	Secret      string            `json:"-" gorm:"type:varchar(64);not null"` // Key download links are signed with
+	ExpiresAt   *time.Time        `json:"expiresAt,omitempty" gorm:"index"`   // When the file is deleted; set once completed
+	CompletedAt *time.Time        `json:"completedAt,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt" gorm:"autoCreateTime;index"`
+}
+
+// TableName specifies the table name for DataExport
+func (DataExport) TableName() string {
+	return "data_exports"
+}
+
+// DataExportResponse is an export with a signed link to download it while it
+// is completed
+type DataExportResponse struct {
+	DataExport
+	DownloadURL       string     `json:"downloadUrl,omitempty"`
+	DownloadExpiresAt *time.Time `json:"downloadExpiresAt,omitempty"`
+}
+
+// CreateDataExportRequest asks for an export of a dataset. From and To bound
+// the time-series datasets, the last day when empty; ClusterID and HostIDs
+// narrow the datasets they apply to.
+type CreateDataExportRequest struct {
+	Dataset   DataExportDataset `json:"dataset"`
+	Format    DataExportFormat  `json:"format"`
+	From      *time.Time        `json:"from,omitempty"`
+	To        *time.Time        `json:"to,omitempty"`
+	ClusterID *uuid.UUID        `json:"clusterId,omitempty"`
+	HostIDs   []uuid.UUID       `json:"hostIds,omitempty"`
+}
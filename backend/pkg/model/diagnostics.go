@@ -0,0 +1,46 @@
+// Package model provides data models for the admin diagnostics bundle
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DiagnosticsManifest describes a diagnostics bundle: the files it holds and
+// the sections that could not be collected
+type DiagnosticsManifest struct {
+	CreatedAt time.Time         `json:"createdAt"`
+	CreatedBy uuid.UUID         `json:"createdBy"`
+	Hostname  string            `json:"hostname"`
+	RequestID string            `json:"requestId,omitempty"`
+	Files     []string          `json:"files"`
+	Errors    map[string]string `json:"errors,omitempty"` // Why a section is missing, by file
+}
+
+// DiagnosticsVersion is the build of the gateway
+type DiagnosticsVersion struct {
+	Module    string `json:"module"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	BuiltAt   string `json:"builtAt,omitempty"`  // Commit time of the revision
+	Modified  bool   `json:"modified,omitempty"` // Built from a working tree with changes
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// MigrationStatus compares the schema version with the migrations of this build
+type MigrationStatus struct {
+	AppliedVersion uint64   `json:"appliedVersion"`
+	Dirty          bool     `json:"dirty"`
+	LatestVersion  uint64   `json:"latestVersion"`
+	Pending        []string `json:"pending,omitempty"` // Migrations newer than the schema
+}
+
+// DiagnosticsInventory counts the hosts, agents and clusters the gateway manages
+type DiagnosticsInventory struct {
+	HostsByStatus    map[string]int64 `json:"hostsByStatus"`
+	AgentsReporting  int64            `json:"agentsReporting"` // Agents that reported recently enough to take commands
+	AgentChannels    int              `json:"agentChannels"`   // Hosts with a command channel open to this gateway
+	ClustersByStatus map[string]int64 `json:"clustersByStatus"`
+}
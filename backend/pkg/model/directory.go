@@ -0,0 +1,168 @@
+// Package model provides data models for directory sync and SCIM provisioning
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdentityProviderSCIM marks identities created by a SCIM client. Their subject is
+// the client's externalId for the user.
+const IdentityProviderSCIM = "scim"
+
+// DirectoryGroup is a group pushed by a SCIM client. Its members get the roles the
+// group's display name maps to in sso.group_role_mapping.
+type DirectoryGroup struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ExternalID  string    `gorm:"size:255" json:"externalId,omitempty"`
+	DisplayName string    `gorm:"size:255;not null;uniqueIndex" json:"displayName"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// TableName specifies the table name for DirectoryGroup
+func (DirectoryGroup) TableName() string {
+	return "directory_groups"
+}
+
+// DirectoryGroupMember is a user's membership of a directory group
+type DirectoryGroupMember struct {
+	GroupID uuid.UUID `gorm:"type:uuid;primary_key" json:"groupId"`
+	UserID  uuid.UUID `gorm:"type:uuid;primary_key;index" json:"userId"`
+}
+
+// TableName specifies the table name for DirectoryGroupMember
+func (DirectoryGroupMember) TableName() string {
+	return "directory_group_members"
+}
+
+// ============== Directory Sync Reports ==============
+
+// Directory sync change actions
+const (
+	DirectoryChangeCreate     = "create"
+	DirectoryChangeUpdate     = "update"
+	DirectoryChangeDeactivate = "deactivate"
+	DirectoryChangeReactivate = "reactivate"
+	DirectoryChangeGrantRole  = "grant_role"
+	DirectoryChangeRevokeRole = "revoke_role"
+	DirectoryChangeConflict   = "conflict"
+)
+
+// DirectorySyncChange is one change a sync made, or would make in a dry run.
+// Conflicts are directory users that could not be synced and were skipped.
+type DirectorySyncChange struct {
+	Action   string     `json:"action"`
+	Username string     `json:"username"`
+	UserID   *uuid.UUID `json:"userId,omitempty"`
+	Detail   string     `json:"detail,omitempty"`
+}
+
+// DirectorySyncReport describes a directory sync run
+type DirectorySyncReport struct {
+	Source     string                `json:"source"`
+	DryRun     bool                  `json:"dryRun"`
+	StartedAt  time.Time             `json:"startedAt"`
+	FinishedAt time.Time             `json:"finishedAt"`
+	Scanned    int                   `json:"scanned"` // Users read from the directory
+	Summary    map[string]int        `json:"summary"` // Changes by action
+	Changes    []DirectorySyncChange `json:"changes"`
+	Error      string                `json:"error,omitempty"`
+}
+
+// Add records a change in the report
+func (r *DirectorySyncReport) Add(change DirectorySyncChange) {
+	r.Changes = append(r.Changes, change)
+	r.Summary[change.Action]++
+}
+
+// ============== SCIM 2.0 Resources ==============
+
+// SCIM schema URNs
+const (
+	ScimSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimSchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ScimSchemaSPConfig     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+// ScimUser is a SCIM user resource
+type ScimUser struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	ExternalID  string           `json:"externalId,omitempty"`
+	UserName    string           `json:"userName"`
+	Name        *ScimName        `json:"name,omitempty"`
+	DisplayName string           `json:"displayName,omitempty"`
+	Emails      []ScimMultiValue `json:"emails,omitempty"`
+	Active      *bool            `json:"active,omitempty"`
+	Groups      []ScimMultiValue `json:"groups,omitempty"`
+	Meta        *ScimMeta        `json:"meta,omitempty"`
+}
+
+// ScimName is the name of a SCIM user
+type ScimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// ScimMultiValue is an entry of a multi-valued SCIM attribute such as emails or members
+type ScimMultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// ScimGroup is a SCIM group resource
+type ScimGroup struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	ExternalID  string           `json:"externalId,omitempty"`
+	DisplayName string           `json:"displayName"`
+	Members     []ScimMultiValue `json:"members,omitempty"`
+	Meta        *ScimMeta        `json:"meta,omitempty"`
+}
+
+// ScimMeta is the metadata of a SCIM resource
+type ScimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location,omitempty"`
+}
+
+// ScimListResponse is a page of SCIM resources
+type ScimListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// ScimPatchRequest is a SCIM PATCH request
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+// ScimPatchOperation is one operation of a SCIM PATCH request
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ScimError is a SCIM error response
+type ScimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
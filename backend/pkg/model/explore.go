@@ -0,0 +1,118 @@
+// Package model provides data models for cross-signal correlation
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CorrelationResourceType is the kind of resource signals are correlated for
+type CorrelationResourceType string
+
+const (
+	CorrelationResourcePod     CorrelationResourceType = "pod"
+	CorrelationResourceHost    CorrelationResourceType = "host"
+	CorrelationResourceService CorrelationResourceType = "service"
+)
+
+// IsValid reports whether the resource type is supported
+func (t CorrelationResourceType) IsValid() bool {
+	switch t {
+	case CorrelationResourcePod, CorrelationResourceHost, CorrelationResourceService:
+		return true
+	}
+	return false
+}
+
+// CorrelationRequest asks for the metrics, logs and traces of one resource over a time range.
+// Data sources default to the user's active source, preferring the one linked to the cluster.
+type CorrelationRequest struct {
+	ResourceType CorrelationResourceType `json:"resourceType"`
+	ClusterID    *uuid.UUID              `json:"clusterId,omitempty"`
+	HostID       *uuid.UUID              `json:"hostId,omitempty"`
+	Namespace    string                  `json:"namespace,omitempty"`
+	Name         string                  `json:"name,omitempty"`
+	Start        time.Time               `json:"start"`
+	End          time.Time               `json:"end"`
+	Step         string                  `json:"step,omitempty"` // e.g. "30s"; derived from the range when empty
+
+	PrometheusDataSourceID *uuid.UUID `json:"prometheusDataSourceId,omitempty"`
+	LogDataSourceID        *uuid.UUID `json:"logDataSourceId,omitempty"`
+	TraceDataSourceID      *uuid.UUID `json:"traceDataSourceId,omitempty"`
+
+	Metrics    []string `json:"metrics,omitempty"`  // Extra PromQL queries; $labels expands to the resource selector
+	LogQuery   string   `json:"logQuery,omitempty"` // Line filter appended to the log selector
+	LogLimit   int      `json:"logLimit,omitempty"`
+	TraceLimit int      `json:"traceLimit,omitempty"`
+}
+
+// CorrelatedResource identifies the resource and the labels used to select its signals
+type CorrelatedResource struct {
+	Type      CorrelationResourceType `json:"type"`
+	Name      string                  `json:"name"`
+	Namespace string                  `json:"namespace,omitempty"`
+	ClusterID *uuid.UUID              `json:"clusterId,omitempty"`
+	HostID    *uuid.UUID              `json:"hostId,omitempty"`
+	Labels    map[string]string       `json:"labels"`
+}
+
+// MetricPoint is one sample, aligned to the correlation step
+type MetricPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// MetricSeries is a metric time series for the correlated resource
+type MetricSeries struct {
+	Name   string            `json:"name"`
+	Query  string            `json:"query"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Points []MetricPoint     `json:"points"`
+}
+
+// CorrelatedMetrics holds the metric section of a correlation result
+type CorrelatedMetrics struct {
+	DataSourceID *uuid.UUID     `json:"dataSourceId,omitempty"`
+	Series       []MetricSeries `json:"series"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// CorrelatedLogs holds the log section of a correlation result
+type CorrelatedLogs struct {
+	DataSourceID *uuid.UUID `json:"dataSourceId,omitempty"`
+	Source       string     `json:"source,omitempty"` // "loki" or "kubernetes"
+	Query        string     `json:"query,omitempty"`
+	Entries      []LogEntry `json:"entries"`
+	Truncated    bool       `json:"truncated,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// CorrelatedTraces holds the trace section of a correlation result
+type CorrelatedTraces struct {
+	DataSourceID *uuid.UUID     `json:"dataSourceId,omitempty"`
+	Traces       []TraceSummary `json:"traces"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// CorrelationBucket counts log lines and traces within one step of the timeline
+type CorrelationBucket struct {
+	Timestamp       time.Time `json:"timestamp"`
+	LogCount        int       `json:"logCount"`
+	ErrorLogCount   int       `json:"errorLogCount"`
+	TraceCount      int       `json:"traceCount"`
+	ErrorTraceCount int       `json:"errorTraceCount"`
+}
+
+// CorrelationResult holds the signals of one resource on a shared time axis.
+// A failing backend is reported in its section's Error without failing the others.
+type CorrelationResult struct {
+	Resource CorrelatedResource  `json:"resource"`
+	Start    time.Time           `json:"start"`
+	End      time.Time           `json:"end"`
+	Step     string              `json:"step"`
+	Metrics  CorrelatedMetrics   `json:"metrics"`
+	Logs     CorrelatedLogs      `json:"logs"`
+	Traces   CorrelatedTraces    `json:"traces"`
+	Timeline []CorrelationBucket `json:"timeline"`
+}
@@ -0,0 +1,113 @@
+// Package model provides data models for feature flags
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Feature flag keys of gated subsystems
+const (
+	FeatureAITools          = "ai.tools"
+	FeatureAnomalyDetection = "ai.anomaly_detection"
+	FeatureAgentCommands    = "agent.commands"
+)
+
+// FeatureFlagDefinition describes a flag the platform checks. Flags without a stored
+// state use Default for everyone.
+type FeatureFlagDefinition struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+}
+
+// FeatureFlagDefinitions is the catalog of built-in flags. Other flags, for example
+// ones only the frontend checks, can be created through the API.
+var FeatureFlagDefinitions = []FeatureFlagDefinition{
+	{Key: FeatureAITools, Description: "AI assistant calls read-only platform tools", Default: true},
+	{Key: FeatureAnomalyDetection, Description: "Running anomaly detection rules", Default: true},
+	{Key: FeatureAgentCommands, Description: "Process, service and schedule operations through host agents", Default: true},
+}
+
+// LookupFeatureFlag returns the definition of a built-in flag
+func LookupFeatureFlag(key string) (FeatureFlagDefinition, bool) {
+	for _, def := range FeatureFlagDefinitions {
+		if def.Key == key {
+			return def, true
+		}
+	}
+	return FeatureFlagDefinition{}, false
+}
+
+// FeatureFlag is the stored state of a flag. A disabled flag is off for everyone.
+// An enabled flag is on for targeted users, departments and roles, and for
+// RolloutPercent of everyone else.
+type FeatureFlag struct {
+	Key         string    `gorm:"size:128;primary_key" json:"key"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+	Description string    `gorm:"type:text" json:"description,omitempty"`
+
+	Enabled        bool `gorm:"default:false" json:"enabled"`
+	RolloutPercent int  `gorm:"default:0" json:"rolloutPercent"`
+
+	// Targeting
+	Users       string `gorm:"type:text" json:"-"` // JSON array of user IDs
+	Departments string `gorm:"type:text" json:"-"` // JSON array of department names
+	Roles       string `gorm:"type:text" json:"-"` // JSON array of role names
+
+	UpdatedBy *uuid.UUID `gorm:"type:uuid" json:"updatedBy,omitempty"`
+}
+
+// TableName specifies the table name for FeatureFlag
+func (FeatureFlag) TableName() string {
+	return "feature_flags"
+}
+
+// FeatureFlagTargets is the decoded targeting of a flag
+type FeatureFlagTargets struct {
+	Users       []uuid.UUID `json:"users"`
+	Departments []string    `json:"departments"`
+	Roles       []string    `json:"roles"`
+}
+
+// Targets decodes the flag's targeting
+func (f *FeatureFlag) Targets() FeatureFlagTargets {
+	targets := FeatureFlagTargets{Users: []uuid.UUID{}, Departments: []string{}, Roles: []string{}}
+	if f.Users != "" {
+		json.Unmarshal([]byte(f.Users), &targets.Users)
+	}
+	if f.Departments != "" {
+		json.Unmarshal([]byte(f.Departments), &targets.Departments)
+	}
+	if f.Roles != "" {
+		json.Unmarshal([]byte(f.Roles), &targets.Roles)
+	}
+	return targets
+}
+
+// FeatureFlagResponse is a flag's definition and current state
+type FeatureFlagResponse struct {
+	FeatureFlagTargets
+	Key            string     `json:"key"`
+	Description    string     `json:"description,omitempty"`
+	BuiltIn        bool       `json:"builtIn"`
+	Default        bool       `json:"default"`
+	Overridden     bool       `json:"overridden"` // State is stored rather than the default
+	Enabled        bool       `json:"enabled"`
+	RolloutPercent int        `json:"rolloutPercent"`
+	UpdatedBy      *uuid.UUID `json:"updatedBy,omitempty"`
+	UpdatedAt      *time.Time `json:"updatedAt,omitempty"`
+}
+
+// UpdateFeatureFlagRequest represents a request to set the state of a flag
+type UpdateFeatureFlagRequest struct {
+	Description    *string     `json:"description"`
+	Enabled        bool        `json:"enabled"`
+	RolloutPercent int         `json:"rolloutPercent"`
+	Users          []uuid.UUID `json:"users"`
+	Departments    []string    `json:"departments"`
+	Roles          []string    `json:"roles"`
+}
@@ -39,6 +39,7 @@ type FileTransfer struct {
 	FileName     string                `json:"fileName" gorm:"type:varchar(256);not null"`
 	FileSize     int64                 `json:"fileSize" gorm:"bigint;default:0"`
 	Transferred  int64                 `json:"transferred" gorm:"bigint;default:0"`
+	Checksum     string                `json:"checksum,omitempty" gorm:"type:varchar(64)"` // SHA-256 of the content, once transferred
 	Status       FileTransferStatus    `json:"status" gorm:"type:varchar(20);not null;index"`
 	ErrorMessage string                `json:"errorMessage,omitempty" gorm:"type:text"`
 	StartedAt    *time.Time            `json:"startedAt,omitempty" gorm:"index"`
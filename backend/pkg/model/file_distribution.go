@@ -0,0 +1,79 @@
+// Package model provides data models for file distribution
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileDistributionSource represents where the distributed file comes from
+type FileDistributionSource string
+
+const (
+	FileDistributionSourceUpload FileDistributionSource = "upload" // Uploaded once through the API
+	FileDistributionSourceURL    FileDistributionSource = "url"    // Fetched from an HTTP(S) or S3 URL
+)
+
+// FileDistribution describes a file pushed to many hosts by a batch task
+type FileDistribution struct {
+	ID          uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	BatchTaskID uuid.UUID              `json:"batchTaskId" gorm:"type:uuid;not null;uniqueIndex"`
+	SourceType  FileDistributionSource `json:"sourceType" gorm:"type:varchar(20);not null"`
+	SourceURL   string                 `json:"sourceUrl,omitempty" gorm:"type:text"`
+	FileName    string                 `json:"fileName" gorm:"type:varchar(256);not null"`
+	FileSize    int64                  `json:"fileSize" gorm:"type:bigint;default:0"`
+	Checksum    string                 `json:"checksum" gorm:"type:varchar(64);not null"` // SHA-256 of the staged file
+	StagedPath  string                 `json:"-" gorm:"type:varchar(512);not null"`
+	TargetPath  string                 `json:"targetPath" gorm:"type:varchar(512);not null"`
+	Mode        string                 `json:"mode,omitempty" gorm:"type:varchar(10)"`
+	Owner       string                 `json:"owner,omitempty" gorm:"type:varchar(64)"`
+	Group       string                 `json:"group,omitempty" gorm:"type:varchar(64)"`
+	Verify      bool                   `json:"verify"`
+	CreatedAt   time.Time              `json:"createdAt" gorm:"type:timestamp;autoCreateTime"`
+	// Relations
+	BatchTask *BatchTask `json:"batchTask,omitempty" gorm:"foreignKey:BatchTaskID"`
+}
+
+// TableName specifies the table name for FileDistribution
+func (FileDistribution) TableName() string {
+	return "file_distributions"
+}
+
+// HostSelector selects target hosts by ID, labels or tags
+type HostSelector struct {
+	HostIDs []uuid.UUID       `json:"hostIds,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"` // All labels must match
+	Tags    []string          `json:"tags,omitempty"`   // Host must carry all tags
+}
+
+// IsEmpty reports whether the selector has no criteria
+func (s HostSelector) IsEmpty() bool {
+	return len(s.HostIDs) == 0 && len(s.Labels) == 0 && len(s.Tags) == 0
+}
+
+// CreateFileDistributionRequest represents a request to distribute a file to many hosts
+type CreateFileDistributionRequest struct {
+	Name        string                `json:"name" binding:"required"`
+	Description string                `json:"description"`
+	SourceURL   string                `json:"sourceUrl"` // Required unless the file is uploaded
+	FileName    string                `json:"fileName"`
+	TargetPath  string                `json:"targetPath" binding:"required"`
+	Mode        string                `json:"mode"`
+	Owner       string                `json:"owner"`
+	Group       string                `json:"group"`
+	Verify      *bool                 `json:"verify"` // Defaults to true
+	Strategy    TaskExecutionStrategy `json:"strategy"`
+	Parallelism int32                 `json:"parallelism"`
+	Timeout     int32                 `json:"timeout"`
+	Selector    HostSelector          `json:"selector" binding:"required"`
+}
+
+// FileDistributionResponse represents a distribution with its per-host verification results
+type FileDistributionResponse struct {
+	*FileDistribution
+	Progress      float64         `json:"progress"` // 0-100
+	VerifiedHosts int             `json:"verifiedHosts"`
+	MismatchHosts int             `json:"mismatchHosts"`
+	Hosts         []BatchTaskHost `json:"hosts"`
+}
@@ -0,0 +1,204 @@
+// Package model provides data models for GitOps: Git repositories of plain
+// manifests kept applied to clusters, and the history of their syncs
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GitOpsAuthType is how the platform authenticates to a Git repository
+type GitOpsAuthType string
+
+const (
+	GitOpsAuthNone  GitOpsAuthType = "none"
+	GitOpsAuthBasic GitOpsAuthType = "basic" // Username with a password or access token, over HTTPS
+	GitOpsAuthSSH   GitOpsAuthType = "ssh"   // Private key
+)
+
+// GitOpsSourceStatus is how a cluster compares to its source's repository
+type GitOpsSourceStatus string
+
+const (
+	GitOpsPending   GitOpsSourceStatus = "pending" // Never synced
+	GitOpsSyncing   GitOpsSourceStatus = "syncing"
+	GitOpsSynced    GitOpsSourceStatus = "synced"
+	GitOpsOutOfSync GitOpsSourceStatus = "out_of_sync" // The branch moved or objects drifted, and they are not synced automatically
+	GitOpsFailed    GitOpsSourceStatus = "failed"      // The last sync or check failed
+)
+
+// GitOpsResourceState is how a managed object compares to its manifest
+type GitOpsResourceState string
+
+const (
+	GitOpsResourceSynced   GitOpsResourceState = "synced"
+	GitOpsResourceDrifted  GitOpsResourceState = "drifted"  // Changed in the cluster
+	GitOpsResourceMissing  GitOpsResourceState = "missing"  // Deleted from the cluster
+	GitOpsResourceOrphaned GitOpsResourceState = "orphaned" // Removed from the repository but not pruned
+	GitOpsResourceFailed   GitOpsResourceState = "failed"
+)
+
+// GitOpsResource is an object a source manages
+type GitOpsResource struct {
+	APIVersion string              `json:"apiVersion"`
+	Kind       string              `json:"kind"`
+	Namespace  string              `json:"namespace,omitempty"`
+	Name       string              `json:"name"`
+	State      GitOpsResourceState `json:"state"`
+	Drift      []string            `json:"drift,omitempty"` // Fields whose live values differ from the manifest
+	Message    string              `json:"message,omitempty"`
+}
+
+// GitOpsSource is a directory of manifests in a Git branch kept applied to a
+// cluster
+type GitOpsSource struct {
+	ID           uuid.UUID          `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID       uuid.UUID          `gorm:"type:uuid;not null;index" json:"userId"`
+	Name         string             `gorm:"size:100;not null" json:"name"`
+	Description  string             `gorm:"type:text" json:"description,omitempty"`
+	RepoURL      string             `gorm:"size:500;not null" json:"repoUrl"`
+	Branch       string             `gorm:"size:255;not null" json:"branch"`
+	Path         string             `gorm:"size:500" json:"path"` // Directory of the manifests; the repository root when empty
+	AuthType     GitOpsAuthType     `gorm:"size:20;not null" json:"authType"`
+	Username     string             `gorm:"size:255" json:"username,omitempty"`
+	Password     string             `gorm:"type:text" json:"-"` // Password or access token
+	SSHKey       string             `gorm:"type:text" json:"-"`
+	ClusterID    uuid.UUID          `gorm:"type:uuid;not null;index" json:"clusterId"`
+	Namespace    string             `gorm:"size:63" json:"namespace,omitempty"`       // Of namespaced manifests that name none
+	AutoSync     bool               `json:"autoSync"`                                 // Apply new commits of the branch
+	Prune        bool               `json:"prune"`                                    // Delete the objects whose manifests were removed
+	SelfHeal     bool               `json:"selfHeal"`                                 // Re-apply objects changed in the cluster
+	SyncInterval int                `gorm:"not null;default:300" json:"syncInterval"` // Seconds between checks
+	Status       GitOpsSourceStatus `gorm:"size:20;not null;index" json:"status"`
+	Revision     string             `gorm:"size:64" json:"revision,omitempty"`     // Commit the last successful sync applied
+	HeadRevision string             `gorm:"size:64" json:"headRevision,omitempty"` // Newest commit of the branch
+	Resources    []GitOpsResource   `gorm:"serializer:json;type:jsonb" json:"resources"`
+	Message      string             `gorm:"type:text" json:"message,omitempty"`
+	LastSyncAt   *time.Time         `json:"lastSyncAt,omitempty"`
+	CheckedAt    *time.Time         `json:"checkedAt,omitempty"`
+	NextCheckAt  time.Time          `gorm:"not null;index" json:"nextCheckAt"`
+	CreatedBy    string             `gorm:"size:255" json:"createdBy,omitempty"`
+	CreatedAt    time.Time          `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt    time.Time          `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// TableName specifies the table name for GitOpsSource
+func (GitOpsSource) TableName() string {
+	return "gitops_sources"
+}
+
+// GitOpsSyncTrigger is what started a sync
+type GitOpsSyncTrigger string
+
+const (
+	GitOpsTriggerAuto     GitOpsSyncTrigger = "auto"      // A new commit of the branch
+	GitOpsTriggerSelfHeal GitOpsSyncTrigger = "self_heal" // Objects drifted
+	GitOpsTriggerManual   GitOpsSyncTrigger = "manual"
+	GitOpsTriggerRollback GitOpsSyncTrigger = "rollback"
+)
+
+// GitOpsSyncStatus is the outcome of a sync
+type GitOpsSyncStatus string
+
+const (
+	GitOpsSyncRunning   GitOpsSyncStatus = "running"
+	GitOpsSyncSucceeded GitOpsSyncStatus = "succeeded"
+	GitOpsSyncFailed    GitOpsSyncStatus = "failed"
+)
+
+// GitOpsSyncAction is what a sync did to an object
+type GitOpsSyncAction string
+
+const (
+	GitOpsActionCreated    GitOpsSyncAction = "created"
+	GitOpsActionConfigured GitOpsSyncAction = "configured"
+	GitOpsActionUnchanged  GitOpsSyncAction = "unchanged"
+	GitOpsActionPruned     GitOpsSyncAction = "pruned"
+	GitOpsActionFailed     GitOpsSyncAction = "failed"
+)
+
+// GitOpsSyncedResource is an object a sync applied or pruned
+type GitOpsSyncedResource struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Namespace  string           `json:"namespace,omitempty"`
+	Name       string           `json:"name"`
+	Action     GitOpsSyncAction `json:"action"`
+	Message    string           `json:"message,omitempty"`
+}
+
+// GitOpsSync is a sync of a source to a commit
+type GitOpsSync struct {
+	ID            uuid.UUID              `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	SourceID      uuid.UUID              `gorm:"type:uuid;not null;index" json:"sourceId"`
+	Trigger       GitOpsSyncTrigger      `gorm:"size:20;not null" json:"trigger"`
+	Revision      string                 `gorm:"size:64" json:"revision"`
+	CommitMessage string                 `gorm:"type:text" json:"commitMessage,omitempty"`
+	CommitAuthor  string                 `gorm:"size:255" json:"commitAuthor,omitempty"`
+	Status        GitOpsSyncStatus       `gorm:"size:20;not null;index" json:"status"`
+	Applied       int                    `json:"applied"`
+	Pruned        int                    `json:"pruned"`
+	Failed        int                    `json:"failed"`
+	Resources     []GitOpsSyncedResource `gorm:"serializer:json;type:jsonb" json:"resources"`
+	Message       string                 `gorm:"type:text" json:"message,omitempty"`
+	TriggeredBy   string                 `gorm:"size:255" json:"triggeredBy,omitempty"`
+	StartedAt     time.Time              `gorm:"not null" json:"startedAt"`
+	FinishedAt    *time.Time             `json:"finishedAt,omitempty"`
+}
+
+// TableName specifies the table name for GitOpsSync
+func (GitOpsSync) TableName() string {
+	return "gitops_syncs"
+}
+
+// CreateGitOpsSourceRequest creates a source. It is checked, and synced when
+// AutoSync is set, within a minute.
+type CreateGitOpsSourceRequest struct {
+	Name         string         `json:"name"`
+	Description  string         `json:"description"`
+	RepoURL      string         `json:"repoUrl"`
+	Branch       string         `json:"branch"` // main when empty
+	Path         string         `json:"path"`
+	AuthType     GitOpsAuthType `json:"authType"` // none when empty
+	Username     string         `json:"username"`
+	Password     string         `json:"password"`
+	SSHKey       string         `json:"sshKey"`
+	ClusterID    uuid.UUID      `json:"clusterId"`
+	Namespace    string         `json:"namespace"`
+	AutoSync     bool           `json:"autoSync"`
+	Prune        bool           `json:"prune"`
+	SelfHeal     bool           `json:"selfHeal"`
+	SyncInterval int            `json:"syncInterval"` // 300 when zero
+}
+
+// UpdateGitOpsSourceRequest changes a source. Credentials left empty are kept.
+type UpdateGitOpsSourceRequest struct {
+	Name         *string         `json:"name"`
+	Description  *string         `json:"description"`
+	RepoURL      *string         `json:"repoUrl"`
+	Branch       *string         `json:"branch"`
+	Path         *string         `json:"path"`
+	AuthType     *GitOpsAuthType `json:"authType"`
+	Username     *string         `json:"username"`
+	Password     *string         `json:"password"`
+	SSHKey       *string         `json:"sshKey"`
+	Namespace    *string         `json:"namespace"`
+	AutoSync     *bool           `json:"autoSync"`
+	Prune        *bool           `json:"prune"`
+	SelfHeal     *bool           `json:"selfHeal"`
+	SyncInterval *int            `json:"syncInterval"`
+}
+
+// SyncGitOpsSourceRequest syncs a source now. Sources that auto-sync return
+// to the head of their branch at the next check.
+type SyncGitOpsSourceRequest struct {
+	Revision string `json:"revision"` // Commit to apply; the head of the branch when empty
+	Prune    *bool  `json:"prune"`    // The source's setting when unset
+}
+
+// RollbackGitOpsSourceRequest re-applies the commit of an earlier successful
+// sync. Auto-sync is turned off so the branch does not undo the rollback.
+type RollbackGitOpsSourceRequest struct {
+	SyncID uuid.UUID `json:"syncId"`
+}
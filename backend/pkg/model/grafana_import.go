@@ -0,0 +1,31 @@
+// Package model provides Grafana dashboard import models
+package model
+
+import "github.com/google/uuid"
+
+// ConvertGrafanaDashboardRequest is a request to convert a synced Grafana dashboard
+// into a platform dashboard
+type ConvertGrafanaDashboardRequest struct {
+	Name         string     `json:"name,omitempty"`         // The Grafana title when empty
+	DataSourceID *uuid.UUID `json:"dataSourceId,omitempty"` // Prometheus data source for panels not matched to one
+	ClusterID    *uuid.UUID `json:"clusterId,omitempty"`    // The Grafana dashboard's cluster when empty
+	IsPublic     bool       `json:"isPublic,omitempty"`
+	DryRun       bool       `json:"dryRun,omitempty"` // Only report what would be imported
+}
+
+// GrafanaImportIssue is a panel that could not be converted
+type GrafanaImportIssue struct {
+	PanelID string `json:"panelId,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Type    string `json:"type"`
+	Reason  string `json:"reason"`
+}
+
+// GrafanaImportResult is the outcome of an import. Dashboard is nil for a dry run.
+type GrafanaImportResult struct {
+	Dashboard      *PrometheusDashboard      `json:"dashboard,omitempty"`
+	Config         PrometheusDashboardConfig `json:"config"`
+	PanelsImported int                       `json:"panelsImported"`
+	Unconverted    []GrafanaImportIssue      `json:"unconverted"`
+	Warnings       []string                  `json:"warnings"`
+}
@@ -0,0 +1,31 @@
+// Package model provides data models for service health reporting
+package model
+
+import "time"
+
+// HealthStatus is the status of a component or of the whole service
+type HealthStatus string
+
+const (
+	HealthStatusUp       HealthStatus = "up"
+	HealthStatusDegraded HealthStatus = "degraded"
+	HealthStatusDown     HealthStatus = "down"
+)
+
+// ComponentHealth is the result of one health check
+type ComponentHealth struct {
+	Name      string                 `json:"name"`
+	Status    HealthStatus           `json:"status"`
+	Critical  bool                   `json:"critical"` // Critical components must be up for the service to be ready
+	Message   string                 `json:"message,omitempty"`
+	LatencyMs int64                  `json:"latencyMs"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// HealthReport is the aggregated result of all health checks
+type HealthReport struct {
+	Status     HealthStatus      `json:"status"`
+	CheckedAt  time.Time         `json:"checkedAt"`
+	Uptime     string            `json:"uptime,omitempty"`
+	Components []ComponentHealth `json:"components"`
+}
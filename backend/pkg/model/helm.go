@@ -187,17 +187,22 @@ type CreateHelmReleaseRequest struct {
 	ChartVersion string    `json:"chartVersion"`
 	Values       string    `json:"values"`
 	Description  string    `json:"description"`
+	Notify       bool      `json:"notify,omitempty"` // Send the changes to the user's notification channels
 }
 
-// UpdateHelmReleaseRequest represents a request to upgrade a Helm release
+// UpdateHelmReleaseRequest represents a request to upgrade a Helm release.
+// Empty fields keep the release's chart version and values.
 type UpdateHelmReleaseRequest struct {
 	ChartVersion string `json:"chartVersion"`
 	Values       string `json:"values"`
+	Notify       bool   `json:"notify,omitempty"`
 }
 
 // RollbackHelmReleaseRequest represents a request to rollback a Helm release
+// to one of its revisions, the previous one when Revision is 0
 type RollbackHelmReleaseRequest struct {
 	Revision int32 `json:"revision"`
+	Notify   bool  `json:"notify,omitempty"`
 }
 
 // ListHelmReleasesRequest represents a request to list Helm releases
@@ -220,3 +225,95 @@ type HelmReleaseHistory struct {
 	Description  string            `json:"description"`
 }
 
+// HelmReleaseAction is a change made to a Helm release
+type HelmReleaseAction string
+
+const (
+	HelmReleaseInstall  HelmReleaseAction = "install"
+	HelmReleaseUpgrade  HelmReleaseAction = "upgrade"
+	HelmReleaseRollback HelmReleaseAction = "rollback"
+)
+
+// HelmReleaseRevision is a revision of a Helm release as the platform deployed
+// it, kept so the release can be rolled back and its changes described
+type HelmReleaseRevision struct {
+	ID           uuid.UUID         `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ReleaseID    uuid.UUID         `json:"releaseId" gorm:"type:uuid;not null;uniqueIndex:idx_helm_release_revision"`
+	Revision     int32             `json:"revision" gorm:"type:int;not null;uniqueIndex:idx_helm_release_revision"`
+	Action       HelmReleaseAction `json:"action" gorm:"type:varchar(20);not null"`
+	Chart        string            `json:"chart" gorm:"type:varchar(500);not null"`
+	ChartVersion string            `json:"chartVersion" gorm:"type:varchar(50);not null"`
+	AppVersion   string            `json:"appVersion" gorm:"type:varchar(50)"`
+	Values       string            `json:"-" gorm:"type:text"`
+	Description  string            `json:"description" gorm:"type:text"`
+	CreatedBy    string            `json:"createdBy,omitempty" gorm:"type:varchar(255)"`
+	CreatedAt    time.Time         `json:"createdAt" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for HelmReleaseRevision
+func (HelmReleaseRevision) TableName() string {
+	return "helm_release_revisions"
+}
+
+// HelmReleaseChange describes an install, upgrade or rollback of a release. It
+// is the data of the helm.release_* events and names the values that changed,
+// never what they changed to, since values often hold secrets.
+type HelmReleaseChange struct {
+	Action           HelmReleaseAction `json:"action"`
+	ReleaseID        uuid.UUID         `json:"releaseId"`
+	ClusterID        uuid.UUID         `json:"clusterId"`
+	Namespace        string            `json:"namespace"`
+	Name             string            `json:"name"`
+	Chart            string            `json:"chart"`
+	FromRevision     int32             `json:"fromRevision,omitempty"`
+	Revision         int32             `json:"revision"`
+	FromChartVersion string            `json:"fromChartVersion,omitempty"`
+	ChartVersion     string            `json:"chartVersion"`
+	ChangedValues    []string          `json:"changedValues"`              // Dotted paths of values added, removed or changed
+	ChangedValuesCut bool              `json:"changedValuesCut,omitempty"` // More values changed than are listed
+	ChangedBy        string            `json:"changedBy,omitempty"`
+}
+
+// Baselines a Helm release preview is diffed against
+const (
+	HelmPreviewBaselineCluster  = "cluster"  // The manifest Helm deployed in the cluster
+	HelmPreviewBaselineRevision = "revision" // The release's current revision rendered, when the cluster has none
+	HelmPreviewBaselineNone     = "none"     // Nothing could be read; every object is added
+)
+
+// Changes a Helm release preview finds to an object
+const (
+	HelmManifestAdded   = "added"
+	HelmManifestChanged = "changed"
+	HelmManifestRemoved = "removed"
+)
+
+// HelmReleasePreview is what upgrading a release with a chart version and
+// values would change: whether the values satisfy the chart's values schema,
+// and the objects of the rendered manifests that differ from the deployed ones.
+// The values of secrets are redacted.
+type HelmReleasePreview struct {
+	ReleaseID        uuid.UUID            `json:"releaseId"`
+	Revision         int32                `json:"revision"` // Of the baseline
+	Chart            string               `json:"chart"`
+	FromChartVersion string               `json:"fromChartVersion"`
+	ChartVersion     string               `json:"chartVersion"`
+	Valid            bool                 `json:"valid"` // The values satisfy the schema and the chart renders
+	SchemaErrors     []string             `json:"schemaErrors"`
+	RenderError      string               `json:"renderError,omitempty"`
+	ChangedValues    []string             `json:"changedValues"`
+	Baseline         string               `json:"baseline"`
+	Changes          []HelmManifestChange `json:"changes"`
+	Unchanged        int                  `json:"unchanged"` // Objects the upgrade leaves as they are
+	Warnings         []string             `json:"warnings"`
+}
+
+// HelmManifestChange is an object of a release the upgrade adds, changes or removes
+type HelmManifestChange struct {
+	Action     string `json:"action"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Diff       string `json:"diff"` // Unified diff of the object's YAML
+}
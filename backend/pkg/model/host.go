@@ -43,6 +43,7 @@ const (
 	HostStatusRejected HostStatus = "rejected" // rejected during registration
 	HostStatusOffline  HostStatus = "offline"  // offline/not reachable
 	HostStatusOnline   HostStatus = "online"   // online and reachable
+	HostStatusDegraded HostStatus = "degraded" // agent reports are late
 )
 
 // Host represents a managed host/server
@@ -60,10 +61,16 @@ type Host struct {
 	Labels      LabelMap       `gorm:"type:jsonb;default:'{}'" json:"labels"`
 	Tags        pq.StringArray `gorm:"type:text[];default:'{}'" json:"tags"`
 	ClusterID   *uuid.UUID     `gorm:"type:uuid" json:"clusterId"`
+	Group       string         `gorm:"column:host_group;size:63;default:''" json:"group"` // Hosts are grouped by name; empty is ungrouped
 	RegisteredBy *uuid.UUID    `gorm:"type:uuid" json:"registeredBy"`
 	ApprovedBy  *uuid.UUID     `gorm:"type:uuid" json:"approvedBy"`
 	ApprovedAt  *time.Time     `json:"approvedAt"`
 	LastSeenAt  *time.Time     `json:"lastSeenAt"`
+	StatusChangedAt *time.Time `json:"statusChangedAt"` // Last heartbeat status transition
+	Lifecycle   HostLifecycle  `gorm:"size:20;not null;default:'active'" json:"lifecycle"`
+	LifecycleChangedAt *time.Time `json:"lifecycleChangedAt"`
+	AgentTokenHash string      `gorm:"size:64" json:"-"` // Hash of the host's own agent token, if it was issued one
+	AgentTokenRevokedAt *time.Time `json:"agentTokenRevokedAt,omitempty"`
 	CreatedAt   time.Time      `json:"createdAt"`
 	UpdatedAt   time.Time      `json:"updatedAt"`
 
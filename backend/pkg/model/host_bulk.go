@@ -0,0 +1,135 @@
+// Package model provides data models for bulk host actions and their approvals
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HostBulkAction is an action applied to many hosts at once
+type HostBulkAction string
+
+const (
+	HostBulkDelete      HostBulkAction = "delete"       // Remove the hosts from the inventory
+	HostBulkRetire      HostBulkAction = "retire"       // Decommission the hosts, archiving their history
+	HostBulkTags        HostBulkAction = "tags"         // Add and remove tags
+	HostBulkLabels      HostBulkAction = "labels"       // Set and remove labels
+	HostBulkAgentConfig HostBulkAction = "agent_config" // Push agent settings
+	HostBulkMove        HostBulkAction = "move"         // Move the hosts to another group
+)
+
+// HostBulkActions lists every bulk host action
+var HostBulkActions = []HostBulkAction{
+	HostBulkDelete,
+	HostBulkRetire,
+	HostBulkTags,
+	HostBulkLabels,
+	HostBulkAgentConfig,
+	HostBulkMove,
+}
+
+// Valid reports whether a is a known bulk host action
+func (a HostBulkAction) Valid() bool {
+	for _, known := range HostBulkActions {
+		if a == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Destructive reports whether the action needs another user's approval before
+// it is applied
+func (a HostBulkAction) Destructive() bool {
+	return a == HostBulkDelete || a == HostBulkRetire
+}
+
+// HostBulkRequest applies an action to many hosts. Only the fields of the
+// action are read.
+type HostBulkRequest struct {
+	HostIDs      []uuid.UUID        `json:"hostIds"`
+	AddTags      []string           `json:"addTags,omitempty"`      // tags
+	RemoveTags   []string           `json:"removeTags,omitempty"`   // tags
+	SetLabels    map[string]string  `json:"setLabels,omitempty"`    // labels
+	RemoveLabels []string           `json:"removeLabels,omitempty"` // labels, keys
+	AgentConfig  *AgentConfigUpdate `json:"agentConfig,omitempty"`  // agent_config
+	Group        string             `json:"group"`                  // move; empty moves the hosts out of their group
+	Reason       string             `json:"reason,omitempty"`       // Why, for the approvers of destructive actions
+}
+
+// HostBulkItemStatus is the outcome of a bulk action on one host
+type HostBulkItemStatus string
+
+const (
+	HostBulkItemSucceeded HostBulkItemStatus = "succeeded"
+	HostBulkItemFailed    HostBulkItemStatus = "failed"
+)
+
+// HostBulkItemResult is the outcome of a bulk action on one host
+type HostBulkItemResult struct {
+	HostID    uuid.UUID          `json:"hostId"`
+	Status    HostBulkItemStatus `json:"status"`
+	Error     string             `json:"error,omitempty"`
+	CommandID *uuid.UUID         `json:"commandId,omitempty"` // agent_config: the command queued for the agent
+}
+
+// HostBulkResult is the outcome of a bulk action, host by host in the order
+// they were requested
+type HostBulkResult struct {
+	Action    HostBulkAction       `json:"action"`
+	Succeeded int                  `json:"succeeded"`
+	Failed    int                  `json:"failed"`
+	Items     []HostBulkItemResult `json:"items"`
+}
+
+// HostBulkApprovalStatus is where a destructive bulk action is in its approval
+type HostBulkApprovalStatus string
+
+const (
+	HostBulkApprovalPending  HostBulkApprovalStatus = "pending"
+	HostBulkApprovalApproved HostBulkApprovalStatus = "approved" // Approved and applied
+	HostBulkApprovalRejected HostBulkApprovalStatus = "rejected"
+	HostBulkApprovalExpired  HostBulkApprovalStatus = "expired" // Not reviewed in time
+)
+
+// HostBulkApproval is a destructive bulk action waiting for, or given, the
+// approval of a user other than the one who requested it. The action is
+// applied when it is approved, and its result kept.
+type HostBulkApproval struct {
+	ID            uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Action        HostBulkAction         `json:"action" gorm:"type:varchar(20);not null"`
+	Request       HostBulkRequest        `json:"request" gorm:"serializer:json;type:jsonb;not null"`
+	Status        HostBulkApprovalStatus `json:"status" gorm:"type:varchar(20);not null;index"`
+	RequestedBy   uuid.UUID              `json:"requestedBy" gorm:"type:uuid;not null;index"`
+	ReviewedBy    *uuid.UUID             `json:"reviewedBy,omitempty" gorm:"type:uuid"`
+	ReviewComment string                 `json:"reviewComment,omitempty" gorm:"type:text"`
+	ReviewedAt    *time.Time             `json:"reviewedAt,omitempty"`
+	Result        *HostBulkResult        `json:"result,omitempty" gorm:"serializer:json;type:jsonb"`
+	ExpiresAt     time.Time              `json:"expiresAt" gorm:"not null"`
+	CreatedAt     time.Time              `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time              `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for HostBulkApproval
+func (HostBulkApproval) TableName() string {
+	return "host_bulk_approvals"
+}
+
+// HostBulkReviewRequest approves or rejects a bulk action
+type HostBulkReviewRequest struct {
+	Comment string `json:"comment,omitempty"`
+}
+
+// AgentCommandConfigUpdate changes the settings of a host's agent
+const AgentCommandConfigUpdate AgentCommandType = "config_update"
+
+// AgentConfigUpdate holds the agent settings that can be changed remotely.
+// Omitted settings keep their value; the agent keeps the settings it is sent
+// across restarts, over its configuration file.
+type AgentConfigUpdate struct {
+	ReportInterval      *int  `json:"reportInterval,omitempty"`      // seconds
+	HeartbeatInterval   *int  `json:"heartbeatInterval,omitempty"`   // seconds
+	CommandPollInterval *int  `json:"commandPollInterval,omitempty"` // seconds
+	CollectNetwork      *bool `json:"collectNetwork,omitempty"`
+}
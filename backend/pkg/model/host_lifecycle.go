@@ -0,0 +1,120 @@
+// Package model provides data models for the lifecycle of hosts
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HostLifecycle is where a host is in its life, independently of whether its
+// agent is reporting
+type HostLifecycle string
+
+const (
+	HostLifecycleProvisioning    HostLifecycle = "provisioning"    // Added, its agent not yet reporting
+	HostLifecycleActive          HostLifecycle = "active"          // In service
+	HostLifecycleMaintenance     HostLifecycle = "maintenance"     // In service, its alerts suppressed
+	HostLifecycleDecommissioning HostLifecycle = "decommissioning" // Being taken out of service, its agent token revoked
+	HostLifecycleRetired         HostLifecycle = "retired"         // Out of service, kept with its history archived
+)
+
+// hostLifecycleTransitions lists the states each state can move to. Retired is
+// final; decommissioning only ends in retired, the agent token being revoked.
+var hostLifecycleTransitions = map[HostLifecycle][]HostLifecycle{
+	HostLifecycleProvisioning:    {HostLifecycleActive, HostLifecycleMaintenance, HostLifecycleDecommissioning},
+	HostLifecycleActive:          {HostLifecycleMaintenance, HostLifecycleDecommissioning},
+	HostLifecycleMaintenance:     {HostLifecycleActive, HostLifecycleDecommissioning},
+	HostLifecycleDecommissioning: {HostLifecycleRetired},
+}
+
+// Valid reports whether l is a known lifecycle state
+func (l HostLifecycle) Valid() bool {
+	_, ok := hostLifecycleTransitions[l]
+	return ok || l == HostLifecycleRetired
+}
+
+// CanTransition reports whether a host can move from l to to
+func (l HostLifecycle) CanTransition(to HostLifecycle) bool {
+	for _, next := range hostLifecycleTransitions[l] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transitions returns the states a host can move to from l
+func (l HostLifecycle) Transitions() []HostLifecycle {
+	return append([]HostLifecycle{}, hostLifecycleTransitions[l]...)
+}
+
+// InService reports whether hosts in l are expected to report and be alerted on
+func (l HostLifecycle) InService() bool {
+	return l == HostLifecycleProvisioning || l == HostLifecycleActive
+}
+
+// HostLifecycleEvent records a host moving from one lifecycle state to another
+type HostLifecycleEvent struct {
+	ID        uuid.UUID     `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	HostID    uuid.UUID     `json:"hostId" gorm:"type:uuid;not null;index"`
+	From      HostLifecycle `json:"from" gorm:"column:from_state;type:varchar(20);not null"`
+	To        HostLifecycle `json:"to" gorm:"column:to_state;type:varchar(20);not null"`
+	Reason    string        `json:"reason,omitempty" gorm:"type:text"`
+	UserID    *uuid.UUID    `json:"userId,omitempty" gorm:"type:uuid"` // nil for automatic transitions
+	CreatedAt time.Time     `json:"createdAt" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for HostLifecycleEvent
+func (HostLifecycleEvent) TableName() string {
+	return "host_lifecycle_events"
+}
+
+// HostLifecycleRequest moves a host to another lifecycle state
+type HostLifecycleRequest struct {
+	Lifecycle HostLifecycle `json:"lifecycle"`
+	Reason    string        `json:"reason,omitempty"`
+}
+
+// HostLifecycleResponse is a host's lifecycle state, the states it can move to
+// and how it got there, latest first
+type HostLifecycleResponse struct {
+	Lifecycle   HostLifecycle        `json:"lifecycle"`
+	Transitions []HostLifecycle      `json:"transitions"`
+	History     []HostLifecycleEvent `json:"history"`
+}
+
+// HostArchive is the history of a decommissioned host, written when it retires
+// so it outlives the host. Deleting a host deletes its live history, metrics
+// included; the archive keeps its lifecycle, agent commands, alerts and events.
+type HostArchive struct {
+	ID             uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	HostID         uuid.UUID       `json:"hostId" gorm:"type:uuid;not null;uniqueIndex"`
+	Hostname       string          `json:"hostname" gorm:"not null"`
+	IPAddress      string          `json:"ipAddress" gorm:"not null"`
+	AgentTokenHash string          `json:"-" gorm:"size:64;index"` // Still refused once the host is deleted
+	History        json.RawMessage `json:"history" gorm:"type:jsonb;not null"`
+	ArchivedBy     *uuid.UUID      `json:"archivedBy,omitempty" gorm:"type:uuid"`
+	ArchivedAt     time.Time       `json:"archivedAt" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for HostArchive
+func (HostArchive) TableName() string {
+	return "host_archives"
+}
+
+// HostArchiveHistory is what an archive keeps of a host
+type HostArchiveHistory struct {
+	Host      Host                 `json:"host"`
+	Lifecycle []HostLifecycleEvent `json:"lifecycle"`
+	Commands  []AgentCommand       `json:"commands"`
+	Alerts    []Alert              `json:"alerts"`
+	Events    []Event              `json:"events"`
+}
+
+// HostAgentTokenResponse carries a host's new agent token, shown only once
+type HostAgentTokenResponse struct {
+	HostID uuid.UUID `json:"hostId"`
+	Token  string    `json:"token"`
+}
@@ -0,0 +1,85 @@
+// Package model provides data models for host metrics history
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Host metrics anomaly rules can target
+const (
+	HostMetricCPUUsage    = "cpu_usage_percent"
+	HostMetricLoad1       = "load1"
+	HostMetricLoad5       = "load5"
+	HostMetricLoad15      = "load15"
+	HostMetricMemoryUsage = "memory_usage_percent"
+	HostMetricMemoryUsed  = "memory_used_bytes"
+	HostMetricSwapUsed    = "swap_used_bytes"
+	HostMetricDiskUsage   = "disk_usage_percent"
+)
+
+// HostMetricNames lists the host metrics in the order they are offered
+var HostMetricNames = []string{
+	HostMetricCPUUsage, HostMetricLoad1, HostMetricLoad5, HostMetricLoad15,
+	HostMetricMemoryUsage, HostMetricMemoryUsed, HostMetricSwapUsed, HostMetricDiskUsage,
+}
+
+// HostMetric is the utilization a host's agent reported at one time
+type HostMetric struct {
+	ID                   uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	HostID               uuid.UUID `json:"hostId" gorm:"type:uuid;not null;index:idx_host_metrics_time"`
+	Timestamp            int64     `json:"timestamp" gorm:"not null;index:idx_host_metrics_time"` // unix seconds
+	CPUUsagePercent      float64   `json:"cpuUsagePercent"`
+	Load1                float64   `json:"load1"`
+	Load5                float64   `json:"load5"`
+	Load15               float64   `json:"load15"`
+	MemoryUsedBytes      int64     `json:"memoryUsedBytes" gorm:"type:bigint"`
+	MemoryAvailableBytes int64     `json:"memoryAvailableBytes" gorm:"type:bigint"`
+	SwapUsedBytes        int64     `json:"swapUsedBytes" gorm:"type:bigint"`
+	DiskUsagePercent     float64   `json:"diskUsagePercent"` // of the fullest disk
+	CreatedAt            time.Time `json:"createdAt" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for HostMetric
+func (HostMetric) TableName() string {
+	return "host_metrics"
+}
+
+// Value returns the named metric of the sample
+func (m *HostMetric) Value(name string) (float64, bool) {
+	switch name {
+	case HostMetricCPUUsage:
+		return m.CPUUsagePercent, true
+	case HostMetricLoad1:
+		return m.Load1, true
+	case HostMetricLoad5:
+		return m.Load5, true
+	case HostMetricLoad15:
+		return m.Load15, true
+	case HostMetricMemoryUsage:
+		total := m.MemoryUsedBytes + m.MemoryAvailableBytes
+		if total <= 0 {
+			return 0, false
+		}
+		return float64(m.MemoryUsedBytes) / float64(total) * 100, true
+	case HostMetricMemoryUsed:
+		return float64(m.MemoryUsedBytes), true
+	case HostMetricSwapUsed:
+		return float64(m.SwapUsedBytes), true
+	case HostMetricDiskUsage:
+		return m.DiskUsagePercent, true
+	default:
+		return 0, false
+	}
+}
+
+// IsHostMetric reports whether name is a host metric rules can target
+func IsHostMetric(name string) bool {
+	for _, n := range HostMetricNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
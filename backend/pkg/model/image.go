@@ -0,0 +1,159 @@
+// Package model provides data models for container images and registries
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RegistryType is the kind of registry, which decides how it authenticates
+type RegistryType string
+
+const (
+	RegistryDockerHub RegistryType = "dockerhub"
+	RegistryHarbor    RegistryType = "harbor"
+	RegistryECR       RegistryType = "ecr" // Username and Password are an AWS access key
+)
+
+// ContainerRegistry holds the credentials used to inspect images of one registry
+// host. Images of registries without one are inspected anonymously.
+type ContainerRegistry struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	CreatedBy uuid.UUID    `gorm:"type:uuid;not null" json:"createdBy"`
+	Name      string       `gorm:"size:255;not null;uniqueIndex" json:"name"`
+	Type      RegistryType `gorm:"size:20;not null" json:"type"`
+	URL       string       `gorm:"size:2048;not null" json:"url"` // e.g. https://harbor.example.com
+
+	// Authentication
+	Username        string `gorm:"size:255" json:"username,omitempty"`
+	Password        string `gorm:"size:2048" json:"-"`
+	Region          string `gorm:"size:50" json:"region,omitempty"` // ECR only; taken from the URL when empty
+	InsecureSkipTLS bool   `gorm:"default:false" json:"insecureSkipTLS"`
+}
+
+// TableName specifies the table name for ContainerRegistry
+func (ContainerRegistry) TableName() string {
+	return "container_registries"
+}
+
+// CreateContainerRegistryRequest is a request to add registry credentials
+type CreateContainerRegistryRequest struct {
+	Name            string       `json:"name"`
+	Type            RegistryType `json:"type"`
+	URL             string       `json:"url"` // registry-1.docker.io when empty for Docker Hub
+	Username        string       `json:"username,omitempty"`
+	Password        string       `json:"password,omitempty"`
+	Region          string       `json:"region,omitempty"`
+	InsecureSkipTLS bool         `json:"insecureSkipTLS,omitempty"`
+}
+
+// UpdateContainerRegistryRequest changes the given fields of a registry
+type UpdateContainerRegistryRequest struct {
+	Name            *string `json:"name,omitempty"`
+	URL             *string `json:"url,omitempty"`
+	Username        *string `json:"username,omitempty"`
+	Password        *string `json:"password,omitempty"`
+	Region          *string `json:"region,omitempty"`
+	InsecureSkipTLS *bool   `json:"insecureSkipTLS,omitempty"`
+}
+
+// ImageReference is an image name split into its parts, with Docker Hub defaults
+// applied: nginx is docker.io/library/nginx:latest
+type ImageReference struct {
+	Registry    string `json:"registry"`   // e.g. docker.io
+	Repository  string `json:"repository"` // e.g. library/nginx
+	Tag         string `json:"tag,omitempty"`
+	Digest      string `json:"digest,omitempty"`      // Set when the image is pinned with @sha256:...
+	ImplicitTag bool   `json:"implicitTag,omitempty"` // No tag or digest was given, so latest is used
+}
+
+// ImageFindingType is a problem with how a workload references its image
+type ImageFindingType string
+
+const (
+	ImageFindingLatestTag   ImageFindingType = "latest_tag"      // Runs :latest, or no tag at all
+	ImageFindingUnpinned    ImageFindingType = "unpinned_digest" // Referenced by tag without a digest
+	ImageFindingDigestDrift ImageFindingType = "digest_drift"    // The tag now points at a digest the pods do not run
+)
+
+// ImageWorkload is a container of a workload running an image
+type ImageWorkload struct {
+	ClusterID   uuid.UUID `json:"clusterId"`
+	ClusterName string    `json:"clusterName"`
+	Namespace   string    `json:"namespace"`
+	Kind        string    `json:"kind"`
+	Name        string    `json:"name"`
+	Container   string    `json:"container"`
+	Init        bool      `json:"init,omitempty"`
+	Digests     []string  `json:"digests,omitempty"` // Digests the pods resolved the image to
+}
+
+// ImageSummary is an image seen in the clusters with the workloads running it
+type ImageSummary struct {
+	Image        string             `json:"image"`
+	Reference    ImageReference     `json:"reference"`
+	Findings     []ImageFindingType `json:"findings"`
+	Workloads    []ImageWorkload    `json:"workloads"`
+	Detail       *ImageDetail       `json:"detail,omitempty"` // Set when resolved against the registry
+	ResolveError string             `json:"resolveError,omitempty"`
+}
+
+// ImageFinding is a workload container whose image reference has findings
+type ImageFinding struct {
+	ImageWorkload
+	Image    string             `json:"image"`
+	Findings []ImageFindingType `json:"findings"`
+}
+
+// ImageInventoryRequest selects the workloads whose images are listed
+type ImageInventoryRequest struct {
+	ClusterIDs []uuid.UUID // Every cluster the user can see when empty
+	Namespace  string      // All namespaces when empty
+	Resolve    bool        // Look every image up in its registry
+}
+
+// ImageInventory is the images running across clusters. Clusters that could not be
+// listed are reported in Clusters, like fan-out queries.
+type ImageInventory struct {
+	Images    []ImageSummary        `json:"images"`
+	Total     int                   `json:"total"`
+	Flagged   int                   `json:"flagged"`   // Workload containers with findings
+	Truncated bool                  `json:"truncated"` // More workloads than one listing returns
+	Clusters  []ClusterFanoutResult `json:"clusters"`
+	Failed    int                   `json:"failed"`
+}
+
+// ImagePlatform is one image of a multi-platform image index
+type ImagePlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+	Digest       string `json:"digest"`
+}
+
+// ImageDetail is what the registry reports for an image. For a multi-platform
+// image, Size, Labels and the platform fields describe its linux/amd64 image.
+type ImageDetail struct {
+	Image        string            `json:"image"`
+	Reference    ImageReference    `json:"reference"`
+	Digest       string            `json:"digest"` // Of the manifest or index the reference points at
+	MediaType    string            `json:"mediaType"`
+	Size         int64             `json:"size"` // Config and layers, compressed
+	Created      *time.Time        `json:"created,omitempty"`
+	OS           string            `json:"os,omitempty"`
+	Architecture string            `json:"architecture,omitempty"`
+	Labels       map[string]string `json:"labels"`
+	Platforms    []ImagePlatform   `json:"platforms,omitempty"`
+	RegistryName string            `json:"registryName,omitempty"` // Credentials used, when not anonymous
+}
+
+// ImageTags is the tags of a repository
+type ImageTags struct {
+	Reference ImageReference `json:"reference"`
+	Tags      []string       `json:"tags"`
+	Truncated bool           `json:"truncated"`
+}
@@ -0,0 +1,72 @@
+// Package model provides data models for the background job queue
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobStatus is the state of a queued job
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"    // Waiting for its run time and a worker
+	JobRunning   JobStatus = "running"   // Claimed by a worker until its lock expires
+	JobSucceeded JobStatus = "succeeded" // Done
+	JobDead      JobStatus = "dead"      // Out of attempts, kept until requeued
+)
+
+// Job is a unit of background work, run by whichever gateway instance claims it
+// first. Failed attempts are retried with backoff; jobs out of attempts are dead
+// lettered.
+type Job struct {
+	ID          uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Type        string          `json:"type" gorm:"type:varchar(100);not null;index"`
+	Priority    int             `json:"priority" gorm:"not null;default:0"` // Higher runs first
+	Payload     json.RawMessage `json:"payload,omitempty" gorm:"type:jsonb"`
+	Status      JobStatus       `json:"status" gorm:"type:varchar(20);not null;index"`
+	Attempts    int             `json:"attempts" gorm:"not null;default:0"`
+	MaxAttempts int             `json:"maxAttempts" gorm:"not null"`
+	RunAt       time.Time       `json:"runAt" gorm:"not null"`                       // When the job is next due
+	LockedUntil *time.Time      `json:"lockedUntil,omitempty"`                       // End of the running attempt's visibility timeout
+	LockedBy    string          `json:"lockedBy,omitempty" gorm:"type:varchar(100)"` // Instance running the attempt
+	LastError   string          `json:"lastError,omitempty" gorm:"type:text"`
+	DurationMs  int64           `json:"durationMs"`            // Of the last attempt
+	CompletedAt *time.Time      `json:"completedAt,omitempty"` // When it succeeded or died
+	CreatedAt   time.Time       `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time       `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for Job
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// JobFilter narrows the jobs listed
+type JobFilter struct {
+	Type   string
+	Status JobStatus
+}
+
+// JobTypeStats are the metrics of one job type: jobs by status from the queue,
+// and attempt counts of this instance since it started
+type JobTypeStats struct {
+	Type           string     `json:"type"`
+	Registered     bool       `json:"registered"` // Whether this instance runs jobs of the type
+	Queued         int64      `json:"queued"`
+	Running        int64      `json:"running"`
+	Succeeded      int64      `json:"succeeded"`
+	Dead           int64      `json:"dead"`
+	OldestQueuedAt *time.Time `json:"oldestQueuedAt,omitempty"` // Run time of the longest waiting due job
+	Enqueued       int64      `json:"enqueued"`
+	Attempts       int64      `json:"attempts"`
+	Failures       int64      `json:"failures"`
+	AvgDurationMs  float64    `json:"avgDurationMs"`
+}
+
+// RequeueJobsRequest requeues the dead jobs of a type, or all dead jobs
+type RequeueJobsRequest struct {
+	Type string `json:"type"`
+}
@@ -25,6 +25,24 @@ const (
 	ClusterTypeSelfHosted ClusterType = "self-hosted" // kubeadm, k3s, etc.
 )
 
+// ClusterConnectionMode is how the platform reaches a cluster's API server
+type ClusterConnectionMode string
+
+const (
+	ClusterConnectionKubeconfig ClusterConnectionMode = "kubeconfig" // dialed directly with a pasted kubeconfig
+	ClusterConnectionConnector  ClusterConnectionMode = "connector"  // through the tunnel the in-cluster connector dials out on
+)
+
+// CredentialExpiryLevel is how close a cluster's kubeconfig credentials are to expiring
+type CredentialExpiryLevel string
+
+const (
+	CredentialExpiryOK       CredentialExpiryLevel = ""
+	CredentialExpiryWarning  CredentialExpiryLevel = "warning"  // within the clusters.credential_expiry_warning window
+	CredentialExpiryCritical CredentialExpiryLevel = "critical" // within a week
+	CredentialExpiryExpired  CredentialExpiryLevel = "expired"
+)
+
 // K8sCluster represents a Kubernetes cluster
 type K8sCluster struct {
 	ID              uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
@@ -41,6 +59,18 @@ type K8sCluster struct {
 	Provider        string         `json:"provider" gorm:"type:varchar(50)"` // aws, gcp, azure, etc.
 	LastConnectedAt *time.Time     `json:"lastConnectedAt" gorm:"type:timestamp"`
 	ErrorMessage    string         `json:"errorMessage" gorm:"type:text"`
+	// In-cluster connector
+	ConnectionMode       ClusterConnectionMode `json:"connectionMode" gorm:"type:varchar(20);default:'kubeconfig'"`
+	ConnectorTokenHash   string                `json:"-" gorm:"type:varchar(64);index"`
+	ConnectorVersion     string                `json:"connectorVersion,omitempty" gorm:"type:varchar(50)"`
+	ConnectorAddress     string                `json:"connectorAddress,omitempty" gorm:"type:varchar(255)"` // Remote address of the tunnel
+	ConnectorConnectedAt *time.Time            `json:"connectorConnectedAt,omitempty" gorm:"type:timestamp"`
+	ConnectorLastSeenAt  *time.Time            `json:"connectorLastSeenAt,omitempty" gorm:"type:timestamp"`
+	// Kubeconfig credential expiry
+	CredentialType        string                `json:"credentialType,omitempty" gorm:"type:varchar(30)"`
+	CredentialExpiresAt   *time.Time            `json:"credentialExpiresAt,omitempty" gorm:"type:timestamp;index"` // Credential or CA expiry, whichever is first
+	CredentialCheckedAt   *time.Time            `json:"credentialCheckedAt,omitempty" gorm:"type:timestamp"`
+	CredentialExpiryLevel CredentialExpiryLevel `json:"credentialExpiryLevel,omitempty" gorm:"type:varchar(20)"` // Last level the owner was warned at
 	CreatedAt       time.Time      `json:"createdAt" gorm:"type:timestamp;autoCreateTime"`
 	UpdatedAt       time.Time      `json:"updatedAt" gorm:"type:timestamp;autoUpdateTime"`
 	// Relations
@@ -72,6 +102,7 @@ type ClusterNode struct {
 	MemoryAllocatable string    `json:"memoryAllocatable" gorm:"type:varchar(20)"`
 	StorageAllocatable string   `json:"storageAllocatable" gorm:"type:varchar(20)"`
 	PodCount          int32     `json:"podCount" gorm:"type:int"`
+	Unschedulable     bool      `json:"unschedulable" gorm:"default:false"` // Cordoned
 	Conditions        string    `json:"conditions" gorm:"type:text"` // JSON string
 	CreatedAt         time.Time `json:"createdAt" gorm:"type:timestamp;autoCreateTime"`
 	UpdatedAt         time.Time `json:"updatedAt" gorm:"type:timestamp;autoUpdateTime"`
@@ -142,6 +173,93 @@ type ClusterConnectionTestResponse struct {
 	Error     string `json:"error,omitempty"`
 }
 
+// CreateConnectorClusterRequest represents a request to onboard a cluster through
+// the in-cluster connector instead of a kubeconfig
+type CreateConnectorClusterRequest struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Type        ClusterType `json:"type"`
+	Region      string      `json:"region"`
+	Provider    string      `json:"provider"`
+	Namespace   string      `json:"namespace"`  // Namespace the connector runs in, myops-connector by default
+	Image       string      `json:"image"`      // Connector image, the platform's by default
+	GatewayURL  string      `json:"gatewayUrl"` // URL the connector dials, the one the request was made to by default
+}
+
+// ConnectorManifestRequest represents the options of a regenerated connector manifest
+type ConnectorManifestRequest struct {
+	Namespace  string `json:"namespace"`
+	Image      string `json:"image"`
+	GatewayURL string `json:"gatewayUrl"`
+}
+
+// ConnectorManifestResponse is a connector manifest with the token embedded in it.
+// The token is only returned here; generating a new manifest revokes the previous one.
+type ConnectorManifestResponse struct {
+	Cluster  *K8sCluster `json:"cluster"`
+	Token    string      `json:"token"`
+	Manifest string      `json:"manifest"` // YAML to kubectl apply in the cluster
+}
+
+// ClusterConnectorStatus represents the state of a cluster's connector tunnel
+type ClusterConnectorStatus struct {
+	Connected   bool       `json:"connected"`
+	Status      string     `json:"status"`
+	Version     string     `json:"version,omitempty"`
+	Address     string     `json:"address,omitempty"`
+	ConnectedAt *time.Time `json:"connectedAt,omitempty"`
+	LastSeenAt  *time.Time `json:"lastSeenAt,omitempty"`
+	Streams     int        `json:"streams"` // Open connections to the API server
+	Error       string     `json:"error,omitempty"`
+}
+
+// ClusterCredentialStatus describes the credentials of a cluster's stored kubeconfig
+type ClusterCredentialStatus struct {
+	ClusterID   uuid.UUID             `json:"clusterId"`
+	Context     string                `json:"context"`
+	Server      string                `json:"server"`
+	Type        string                `json:"type"` // client-certificate, token, exec, auth-provider, basic-auth or none
+	Subject     string                `json:"subject,omitempty"`
+	Issuer      string                `json:"issuer,omitempty"`
+	ExpiresAt   *time.Time            `json:"expiresAt,omitempty"`
+	CAExpiresAt *time.Time            `json:"caExpiresAt,omitempty"`
+	ExpiresIn   *int64                `json:"expiresIn,omitempty"` // Seconds until the credentials or CA expire
+	Level       CredentialExpiryLevel `json:"level"`
+	CheckedAt   time.Time             `json:"checkedAt"`
+}
+
+// RotateClusterCredentialsRequest represents a request to replace a cluster's kubeconfig
+type RotateClusterCredentialsRequest struct {
+	Kubeconfig string `json:"kubeconfig"`
+	Endpoint   string `json:"endpoint"` // Overrides the kubeconfig's server, the current endpoint by default
+	Force      bool   `json:"force"`    // Switch over even when the new credentials reach a different cluster
+}
+
+// IssueKubeconfigRequest represents a request for a kubeconfig scoped to the
+// user's permissions on a cluster
+type IssueKubeconfigRequest struct {
+	Namespace  string `json:"namespace"`  // Limits the kubeconfig to a namespace; cluster-wide when empty
+	TTLMinutes int    `json:"ttlMinutes"` // How long the token is valid, 60 minutes by default
+}
+
+// DrainNodeRequest represents a request to drain a node for maintenance
+type DrainNodeRequest struct {
+	GracePeriodSeconds *int64 `json:"gracePeriodSeconds,omitempty"` // The pods' own grace period when empty
+	IgnoreDaemonSets   bool   `json:"ignoreDaemonSets"`             // Leave DaemonSet pods running instead of refusing the drain
+	DeleteEmptyDirData bool   `json:"deleteEmptyDirData"`           // Evict pods with emptyDir volumes
+	Force              bool   `json:"force"`                        // Evict pods no controller will recreate
+	TimeoutSeconds     int    `json:"timeoutSeconds"`               // How long to wait for the node to empty, 10 minutes by default
+}
+
+// ScopedKubeconfig is a time-limited kubeconfig issued to a user
+type ScopedKubeconfig struct {
+	Kubeconfig     string    `json:"kubeconfig"`
+	ServiceAccount string    `json:"serviceAccount"` // namespace/name of the account it authenticates as
+	Namespace      string    `json:"namespace,omitempty"`
+	Permissions    []string  `json:"permissions"` // Platform permissions the kubeconfig carries, such as pods.logs
+	ExpiresAt      time.Time `json:"expiresAt"`
+}
+
 // ClusterSummary represents a summary of cluster resources
 type ClusterSummary struct {
 	NodeCount        int32 `json:"nodeCount"`
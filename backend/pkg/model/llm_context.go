@@ -0,0 +1,58 @@
+// Package model provides data models for LLM conversation context
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LLM context sections, in priority order
+const (
+	LLMContextCluster = "cluster"
+	LLMContextAlerts  = "alerts"
+	LLMContextEvents  = "events"
+	LLMContextMetrics = "metrics"
+)
+
+// LLMContextSections lists every context section in priority order
+var LLMContextSections = []string{LLMContextCluster, LLMContextAlerts, LLMContextEvents, LLMContextMetrics}
+
+// LLMContextSnapshot records the cluster context injected into a conversation for one reply
+type LLMContextSnapshot struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+
+	ConversationID uuid.UUID  `gorm:"type:uuid;not null;index:idx_llm_context_conversation_id" json:"conversationId"`
+	ClusterID      *uuid.UUID `gorm:"type:uuid" json:"clusterId,omitempty"`
+
+	Content         string `gorm:"type:text;not null" json:"content"`   // Rendered system context
+	Sections        string `gorm:"type:text" json:"sections,omitempty"` // JSON: []LLMContextSection
+	Budget          int    `json:"budget"`                              // Character budget for Content
+	Size            int    `json:"size"`                                // Characters used
+	EstimatedTokens int    `json:"estimatedTokens"`
+	Truncated       bool   `gorm:"default:false" json:"truncated"`
+}
+
+// TableName specifies the table name for LLMContextSnapshot
+func (LLMContextSnapshot) TableName() string {
+	return "llm_context_snapshots"
+}
+
+// LLMContextSection describes one section of a context snapshot
+type LLMContextSection struct {
+	Name      string `json:"name"`
+	Items     int    `json:"items"`             // Items included
+	Omitted   int    `json:"omitted,omitempty"` // Items dropped to fit the budget
+	Size      int    `json:"size"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// LLMChatMessage is one message of the prompt sent to the LLM
+type LLMChatMessage struct {
+	Role       string        `json:"role"` // system, user, assistant, tool
+	Content    string        `json:"content"`
+	ToolCalls  []LLMToolCall `json:"tool_calls,omitempty"`   // Tools the assistant asked to run
+	ToolCallID string        `json:"tool_call_id,omitempty"` // The call a tool message answers
+}
@@ -0,0 +1,68 @@
+// Package model provides data models for LLM tool calling
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LLMToolCall is a function call requested by the LLM
+type LLMToolCall struct {
+	ID       string              `json:"id"`
+	Type     string              `json:"type"` // always "function"
+	Function LLMToolFunctionCall `json:"function"`
+}
+
+// LLMToolFunctionCall names the function and carries its JSON-encoded arguments
+type LLMToolFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// LLMToolDefinition describes a tool offered to the LLM
+type LLMToolDefinition struct {
+	Type     string                `json:"type"` // always "function"
+	Function LLMToolFunctionSchema `json:"function"`
+}
+
+// LLMToolFunctionSchema is a function name, description and JSON Schema for its arguments
+type LLMToolFunctionSchema struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// LLMToolInvocationStatus is the outcome of a tool invocation
+type LLMToolInvocationStatus string
+
+const (
+	LLMToolSuccess LLMToolInvocationStatus = "success"
+	LLMToolDenied  LLMToolInvocationStatus = "denied"
+	LLMToolFailed  LLMToolInvocationStatus = "failed"
+)
+
+// LLMToolInvocation records one tool the LLM ran on behalf of a user
+type LLMToolInvocation struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+
+	ConversationID uuid.UUID  `gorm:"type:uuid;not null;index:idx_llm_tool_conversation_id" json:"conversationId"`
+	MessageID      *uuid.UUID `gorm:"type:uuid;index:idx_llm_tool_message_id" json:"messageId,omitempty"` // Assistant reply the tool contributed to
+	UserID         uuid.UUID  `gorm:"type:uuid;not null" json:"userId"`
+	ClusterID      *uuid.UUID `gorm:"type:uuid" json:"clusterId,omitempty"`
+
+	ToolCallID string                  `gorm:"size:255" json:"toolCallId"`
+	Tool       string                  `gorm:"size:100;not null" json:"tool"`
+	Arguments  string                  `gorm:"type:text" json:"arguments"`
+	Status     LLMToolInvocationStatus `gorm:"size:20;not null" json:"status"`
+	Result     string                  `gorm:"type:text" json:"result,omitempty"` // As returned to the LLM, truncated
+	Error      string                  `gorm:"type:text" json:"error,omitempty"`
+	DurationMs int64                   `json:"durationMs"`
+}
+
+// TableName specifies the table name for LLMToolInvocation
+func (LLMToolInvocation) TableName() string {
+	return "llm_tool_invocations"
+}
@@ -0,0 +1,67 @@
+// Package model provides LLM usage and cost reporting models
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LLMModelPrice is the price of a model in USD per million tokens
+type LLMModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// LLMBudgetStatus is the monthly token budget of a user or org
+type LLMBudgetStatus struct {
+	Limit     int64 `json:"limit"`
+	Used      int64 `json:"used"`
+	Remaining int64 `json:"remaining"`
+	Soft      bool  `json:"soft"` // Exceeding the budget warns instead of blocking
+	Exceeded  bool  `json:"exceeded"`
+}
+
+// LLMUsageTotals are token counts and cost of a set of assistant replies
+type LLMUsageTotals struct {
+	Messages         int64   `json:"messages"`
+	Tokens           int64   `json:"tokens"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// LLMModelUsage is the usage of one model
+type LLMModelUsage struct {
+	Model string `json:"model"`
+	LLMUsageTotals
+}
+
+// LLMConversationUsage is the usage of one conversation
+type LLMConversationUsage struct {
+	ConversationID uuid.UUID `json:"conversationId"`
+	Title          string    `json:"title,omitempty"`
+	UserID         uuid.UUID `json:"userId"`
+	LLMUsageTotals
+}
+
+// LLMUserUsage is the usage of one user of an org
+type LLMUserUsage struct {
+	UserID   uuid.UUID `json:"userId"`
+	Username string    `json:"username"`
+	LLMUsageTotals
+}
+
+// LLMUsageReport is the LLM usage of a user or org in a month
+type LLMUsageReport struct {
+	Scope          string                 `json:"scope"` // user or org
+	Subject        string                 `json:"subject"`
+	PeriodStart    time.Time              `json:"periodStart"`
+	PeriodEnd      time.Time              `json:"periodEnd"`
+	Currency       string                 `json:"currency"`
+	Totals         LLMUsageTotals         `json:"totals"`
+	Budget         *LLMBudgetStatus       `json:"budget,omitempty"` // Only for the current month
+	ByModel        []LLMModelUsage        `json:"byModel"`
+	ByConversation []LLMConversationUsage `json:"byConversation"`
+	ByUser         []LLMUserUsage         `json:"byUser,omitempty"` // Only for orgs
+}
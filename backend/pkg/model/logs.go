@@ -0,0 +1,89 @@
+// Package model provides data models for log backends
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LogBackendType represents the kind of log backend
+type LogBackendType string
+
+const (
+	LogBackendLoki LogBackendType = "loki"
+)
+
+// IsValid reports whether the backend type is supported
+func (t LogBackendType) IsValid() bool {
+	return t == LogBackendLoki
+}
+
+// LogDataSource represents a log query endpoint such as Loki
+type LogDataSource struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	UserID    uuid.UUID      `gorm:"type:uuid;not null;index:idx_log_ds_user_id" json:"userId"`
+	ClusterID *uuid.UUID     `gorm:"type:uuid;index:idx_log_ds_cluster_id" json:"clusterId,omitempty"`
+	Name      string         `gorm:"size:255;not null" json:"name"`
+	Type      LogBackendType `gorm:"size:20;not null" json:"type"`
+	URL       string         `gorm:"size:2048;not null" json:"url"`
+	Username  string         `gorm:"size:255" json:"username,omitempty"`
+	Password  string         `gorm:"size:255" json:"-"`                  // Never expose in JSON
+	Token     string         `gorm:"size:2048" json:"-"`                 // Bearer token, never exposed
+	TenantID  string         `gorm:"size:255" json:"tenantId,omitempty"` // X-Scope-OrgID for multi-tenant Loki
+	Status    string         `gorm:"size:50;default:active" json:"status"`
+
+	InsecureSkipTLS bool   `gorm:"default:false" json:"insecureSkipTLS"`
+	Headers         string `gorm:"type:text" json:"headers,omitempty"` // JSON object of extra request headers
+
+	// Test results
+	LastTestAt     *time.Time `json:"lastTestAt,omitempty"`
+	LastTestStatus string     `gorm:"size:50" json:"lastTestStatus,omitempty"`
+	LastTestError  string     `gorm:"type:text" json:"lastTestError,omitempty"`
+
+	// Relationships
+	Cluster *K8sCluster `gorm:"foreignKey:ClusterID" json:"cluster,omitempty"`
+}
+
+// TableName specifies the table name for LogDataSource
+func (LogDataSource) TableName() string {
+	return "log_data_sources"
+}
+
+// CreateLogDataSourceRequest represents a request to create a log data source
+type CreateLogDataSourceRequest struct {
+	ClusterID       *uuid.UUID     `json:"clusterId,omitempty"`
+	Name            string         `json:"name"`
+	Type            LogBackendType `json:"type"`
+	URL             string         `json:"url"`
+	Username        string         `json:"username,omitempty"`
+	Password        string         `json:"password,omitempty"`
+	Token           string         `json:"token,omitempty"`
+	TenantID        string         `json:"tenantId,omitempty"`
+	InsecureSkipTLS bool           `json:"insecureSkipTLS,omitempty"`
+	Headers         string         `json:"headers,omitempty"`
+}
+
+// UpdateLogDataSourceRequest represents a request to update a log data source
+type UpdateLogDataSourceRequest struct {
+	Name            *string `json:"name,omitempty"`
+	URL             *string `json:"url,omitempty"`
+	Username        *string `json:"username,omitempty"`
+	Password        *string `json:"password,omitempty"`
+	Token           *string `json:"token,omitempty"`
+	TenantID        *string `json:"tenantId,omitempty"`
+	InsecureSkipTLS *bool   `json:"insecureSkipTLS,omitempty"`
+	Headers         *string `json:"headers,omitempty"`
+	Status          *string `json:"status,omitempty"`
+}
+
+// LogEntry is a single log line
+type LogEntry struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Line      string            `json:"line"`
+	Level     string            `json:"level,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
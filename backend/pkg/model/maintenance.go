@@ -0,0 +1,152 @@
+// Package model provides data models for scheduled maintenance windows
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaintenanceRecurrence is how often a maintenance window repeats
+type MaintenanceRecurrence string
+
+const (
+	MaintenanceRecurrenceNone   MaintenanceRecurrence = ""
+	MaintenanceRecurrenceDaily  MaintenanceRecurrence = "daily"
+	MaintenanceRecurrenceWeekly MaintenanceRecurrence = "weekly"
+)
+
+// IsValid reports whether the recurrence is supported
+func (r MaintenanceRecurrence) IsValid() bool {
+	switch r {
+	case MaintenanceRecurrenceNone, MaintenanceRecurrenceDaily, MaintenanceRecurrenceWeekly:
+		return true
+	}
+	return false
+}
+
+// Period returns the interval between occurrences, or zero for one-off windows
+func (r MaintenanceRecurrence) Period() time.Duration {
+	switch r {
+	case MaintenanceRecurrenceDaily:
+		return 24 * time.Hour
+	case MaintenanceRecurrenceWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// Maintenance window status constants
+const (
+	MaintenanceStatusScheduled = "scheduled"
+	MaintenanceStatusActive    = "active"
+	MaintenanceStatusExpired   = "expired"
+)
+
+// AlertMatcher selects alerts by one field. Field is severity, clusterId, hostId, ruleId
+// or title; any other name matches the alert label of that name.
+type AlertMatcher struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"` // =, !=, =~, !~
+	Value    string `json:"value"`
+}
+
+// MaintenanceWindow suppresses matching alerts and their notifications while active
+type MaintenanceWindow struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index:idx_maintenance_user_id" json:"userId"`
+	Name        string    `gorm:"size:255;not null" json:"name"`
+	Description string    `gorm:"type:text" json:"description,omitempty"`
+	Matchers    string    `gorm:"type:text;not null" json:"-"` // JSON array of AlertMatcher
+
+	// First occurrence; recurring windows repeat it every period until RecurrenceEnd
+	StartsAt      time.Time             `gorm:"not null" json:"startsAt"`
+	EndsAt        time.Time             `gorm:"not null" json:"endsAt"`
+	Recurrence    MaintenanceRecurrence `gorm:"size:20" json:"recurrence,omitempty"`
+	RecurrenceEnd *time.Time            `json:"recurrenceEnd,omitempty"`
+
+	ExpiredAt *time.Time `gorm:"index" json:"expiredAt,omitempty"` // Set when ended early
+	CreatedBy string     `gorm:"size:255" json:"createdBy,omitempty"`
+}
+
+// TableName specifies the table name for MaintenanceWindow
+func (MaintenanceWindow) TableName() string {
+	return "maintenance_windows"
+}
+
+// OccurrenceAt returns the bounds of the occurrence covering t, if any
+func (w *MaintenanceWindow) OccurrenceAt(t time.Time) (start, end time.Time, ok bool) {
+	if w.ExpiredAt != nil && !t.Before(*w.ExpiredAt) {
+		return time.Time{}, time.Time{}, false
+	}
+	if t.Before(w.StartsAt) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	start, end = w.StartsAt, w.EndsAt
+	if period := w.Recurrence.Period(); period > 0 {
+		n := t.Sub(w.StartsAt) / period
+		start = w.StartsAt.Add(n * period)
+		end = start.Add(w.EndsAt.Sub(w.StartsAt))
+		if w.RecurrenceEnd != nil && start.After(*w.RecurrenceEnd) {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	if !t.Before(end) {
+		return time.Time{}, time.Time{}, false
+	}
+	if w.ExpiredAt != nil && w.ExpiredAt.Before(end) {
+		end = *w.ExpiredAt
+	}
+	return start, end, true
+}
+
+// StatusAt reports whether the window is scheduled, active or expired at t
+func (w *MaintenanceWindow) StatusAt(t time.Time) string {
+	if _, _, ok := w.OccurrenceAt(t); ok {
+		return MaintenanceStatusActive
+	}
+	if w.ExpiredAt != nil && !t.Before(*w.ExpiredAt) {
+		return MaintenanceStatusExpired
+	}
+	if t.Before(w.StartsAt) {
+		return MaintenanceStatusScheduled
+	}
+	if w.Recurrence.Period() > 0 && (w.RecurrenceEnd == nil || t.Before(*w.RecurrenceEnd)) {
+		return MaintenanceStatusScheduled
+	}
+	return MaintenanceStatusExpired
+}
+
+// MaintenanceWindowResponse is a maintenance window with its decoded matchers and status
+type MaintenanceWindowResponse struct {
+	MaintenanceWindow
+	Matchers []AlertMatcher `json:"matchers"`
+	Status   string         `json:"status"`
+}
+
+// Response decodes the window's matchers and computes its status at now
+func (w *MaintenanceWindow) Response(now time.Time) MaintenanceWindowResponse {
+	resp := MaintenanceWindowResponse{
+		MaintenanceWindow: *w,
+		Matchers:          []AlertMatcher{},
+		Status:            w.StatusAt(now),
+	}
+	json.Unmarshal([]byte(w.Matchers), &resp.Matchers)
+	return resp
+}
+
+// CreateMaintenanceWindowRequest represents a request to create a maintenance window
+type CreateMaintenanceWindowRequest struct {
+	Name          string                `json:"name"`
+	Description   string                `json:"description,omitempty"`
+	Matchers      []AlertMatcher        `json:"matchers"`
+	StartsAt      time.Time             `json:"startsAt"`
+	EndsAt        time.Time             `json:"endsAt"`
+	Recurrence    MaintenanceRecurrence `json:"recurrence,omitempty"`
+	RecurrenceEnd *time.Time            `json:"recurrenceEnd,omitempty"`
+}
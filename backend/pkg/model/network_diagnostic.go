@@ -0,0 +1,169 @@
+// Package model provides data models for network diagnostics run by host agents
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NetworkDiagnosticType is the kind of test a diagnostic runs
+type NetworkDiagnosticType string
+
+const (
+	NetworkDiagnosticDNS        NetworkDiagnosticType = "dns"        // Resolve a name, optionally tracing the delegation with dig
+	NetworkDiagnosticTraceroute NetworkDiagnosticType = "traceroute" // One probe per hop with traceroute
+	NetworkDiagnosticMTR        NetworkDiagnosticType = "mtr"        // Loss and latency per hop over several cycles with mtr
+	NetworkDiagnosticTCP        NetworkDiagnosticType = "tcp"        // Connect to host:port a few times
+	NetworkDiagnosticBandwidth  NetworkDiagnosticType = "bandwidth"  // Send to the agent of a peer host for a while
+)
+
+// NetworkDiagnosticStatus is the state of a diagnostic
+type NetworkDiagnosticStatus string
+
+const (
+	NetworkDiagnosticRunning   NetworkDiagnosticStatus = "running"
+	NetworkDiagnosticCompleted NetworkDiagnosticStatus = "completed" // The agent ran the test; the target may still have failed it
+	NetworkDiagnosticFailed    NetworkDiagnosticStatus = "failed"    // The test could not be run
+)
+
+// NetworkDiagnostic is a network test run from a host's agent and its result,
+// kept so reachability problems can be investigated after the fact
+type NetworkDiagnostic struct {
+	ID           uuid.UUID               `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID       uuid.UUID               `json:"userId" gorm:"type:uuid;not null;index"` // Who ran it
+	HostID       uuid.UUID               `json:"hostId" gorm:"type:uuid;not null;index"`
+	HostName     string                  `json:"hostName" gorm:"type:varchar(255)"`
+	Type         NetworkDiagnosticType   `json:"type" gorm:"type:varchar(20);not null;index"`
+	Target       string                  `json:"target" gorm:"type:varchar(255);not null"` // Name, host or host:port; the peer's address for bandwidth tests
+	PeerHostID   *uuid.UUID              `json:"peerHostId,omitempty" gorm:"type:uuid;index"`
+	PeerHostName string                  `json:"peerHostName,omitempty" gorm:"type:varchar(255)"`
+	Options      json.RawMessage         `json:"options,omitempty" gorm:"type:jsonb"` // The NetworkDiagnosticSpec sent to the agent
+	Status       NetworkDiagnosticStatus `json:"status" gorm:"type:varchar(20);not null;index"`
+	Summary      string                  `json:"summary,omitempty" gorm:"type:varchar(255)"` // e.g. 12 hops, destination reached
+	Result       json.RawMessage         `json:"result,omitempty" gorm:"type:jsonb"`         // DNSLookupResult, TraceResult, TCPConnectResult or BandwidthResult
+	Error        string                  `json:"error,omitempty" gorm:"type:text"`
+	OperationID  *uuid.UUID              `json:"operationId,omitempty" gorm:"type:uuid"`
+	Duration     int64                   `json:"duration"` // milliseconds
+	StartedAt    time.Time               `json:"startedAt"`
+	CompletedAt  *time.Time              `json:"completedAt,omitempty"`
+	CreatedAt    time.Time               `json:"createdAt" gorm:"autoCreateTime;index"`
+}
+
+// TableName specifies the table name for NetworkDiagnostic
+func (NetworkDiagnostic) TableName() string {
+	return "network_diagnostics"
+}
+
+// RunNetworkDiagnosticRequest is a request to run a test from a host's agent.
+// Options that do not apply to the type are ignored.
+type RunNetworkDiagnosticRequest struct {
+	HostID     uuid.UUID             `json:"hostId"`
+	Type       NetworkDiagnosticType `json:"type"`
+	Target     string                `json:"target"`               // Not used by bandwidth tests
+	Port       int                   `json:"port,omitempty"`       // tcp, and bandwidth where it defaults to 5201
+	RecordType string                `json:"recordType,omitempty"` // dns: A (default), AAAA, CNAME, MX, NS, TXT or PTR
+	Server     string                `json:"server,omitempty"`     // dns: the resolver to ask; the host's when empty
+	Trace      bool                  `json:"trace,omitempty"`      // dns: trace the delegation from the root with dig +trace
+	Count      int                   `json:"count,omitempty"`      // mtr cycles (10) or tcp attempts (3)
+	MaxHops    int                   `json:"maxHops,omitempty"`    // traceroute and mtr; 30 when omitted
+	PeerHostID *uuid.UUID            `json:"peerHostId,omitempty"` // bandwidth: the host receiving the traffic
+	Duration   int                   `json:"duration,omitempty"`   // bandwidth: seconds of traffic; 10 when omitted
+}
+
+// NetworkDiagnosticSpec is what an agent runs; agents get it as the args of a
+// network_diagnostic command
+type NetworkDiagnosticSpec struct {
+	Type       NetworkDiagnosticType `json:"type"`
+	Target     string                `json:"target"`
+	Port       int                   `json:"port,omitempty"`
+	RecordType string                `json:"recordType,omitempty"`
+	Server     string                `json:"server,omitempty"`
+	Trace      bool                  `json:"trace,omitempty"`
+	Count      int                   `json:"count,omitempty"`
+	MaxHops    int                   `json:"maxHops,omitempty"`
+	Duration   int                   `json:"duration,omitempty"` // seconds
+	Token      string                `json:"token,omitempty"`    // bandwidth: proves the connection to the peer's agent; not stored
+}
+
+// BandwidthServerSpec has an agent accept one bandwidth test connection; agents
+// get it as the args of a bandwidth_server command and answer BandwidthServerInfo
+// once listening
+type BandwidthServerSpec struct {
+	Port     int    `json:"port"`
+	Token    string `json:"token"`
+	Duration int    `json:"duration"` // seconds of traffic the test sends
+}
+
+// BandwidthServerInfo is where a bandwidth server listens
+type BandwidthServerInfo struct {
+	Port int `json:"port"`
+}
+
+// DNSRecord is a record a lookup returned
+type DNSRecord struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// DNSLookupResult is the result of a dns diagnostic
+type DNSLookupResult struct {
+	Server     string      `json:"server,omitempty"` // The resolver asked; empty for the host's
+	RecordType string      `json:"recordType"`
+	Records    []DNSRecord `json:"records"`
+	Latency    float64     `json:"latency"`         // milliseconds
+	Trace      string      `json:"trace,omitempty"` // Output of dig +trace
+	Error      string      `json:"error,omitempty"` // Why the name did not resolve
+}
+
+// TraceHop is a hop of a traceroute or mtr report. Hops that did not answer
+// have no address and 100% loss.
+type TraceHop struct {
+	Hop      int     `json:"hop"`
+	Address  string  `json:"address,omitempty"`
+	Hostname string  `json:"hostname,omitempty"`
+	Sent     int     `json:"sent"`
+	Loss     float64 `json:"loss"`           // percent
+	Last     float64 `json:"last,omitempty"` // milliseconds
+	Best     float64 `json:"best,omitempty"`
+	Avg      float64 `json:"avg,omitempty"`
+	Worst    float64 `json:"worst,omitempty"`
+}
+
+// TraceResult is the result of a traceroute or mtr diagnostic
+type TraceResult struct {
+	Hops    []TraceHop `json:"hops"`
+	Reached bool       `json:"reached"` // Whether the last hop is the target
+	Output  string     `json:"output,omitempty"`
+}
+
+// TCPConnectAttempt is one connection attempt of a tcp diagnostic
+type TCPConnectAttempt struct {
+	Latency float64 `json:"latency"` // milliseconds
+	Error   string  `json:"error,omitempty"`
+}
+
+// TCPConnectResult is the result of a tcp diagnostic
+type TCPConnectResult struct {
+	Address   string              `json:"address,omitempty"` // The address connected to
+	Attempts  []TCPConnectAttempt `json:"attempts"`
+	Succeeded int                 `json:"succeeded"`
+}
+
+// BandwidthResult is the result of a bandwidth diagnostic, as counted by the peer
+type BandwidthResult struct {
+	Bytes         int64   `json:"bytes"`
+	Seconds       float64 `json:"seconds"`
+	BitsPerSecond float64 `json:"bitsPerSecond"`
+}
+
+// NetworkDiagnosticFilter selects diagnostics of the history
+type NetworkDiagnosticFilter struct {
+	HostID   *uuid.UUID // Run from or to the host
+	Type     NetworkDiagnosticType
+	Status   NetworkDiagnosticStatus
+	Search   string // Matches the target
+	Page     int
+	PageSize int
+}
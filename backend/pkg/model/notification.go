@@ -38,39 +38,188 @@ const (
 	NotificationStatusDelivered NotificationStatus = "delivered"
 )
 
+// NotificationSource names the module a notification comes from
+type NotificationSource string
+
+const (
+	NotificationSourceAlerts       NotificationSource = "alerts"
+	NotificationSourceBatchTasks   NotificationSource = "batch_tasks"
+	NotificationSourceAI           NotificationSource = "ai"
+	NotificationSourceHosts        NotificationSource = "hosts"
+	NotificationSourceClusters     NotificationSource = "clusters"
+	NotificationSourceSystem       NotificationSource = "system"
+	NotificationSourceReports      NotificationSource = "reports"
+	NotificationSourceCertificates NotificationSource = "certificates"
+	NotificationSourceHelm         NotificationSource = "helm"
+)
+
 // Notification represents a user notification
 type Notification struct {
-	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
-	UserID      uuid.UUID `gorm:"type:uuid;index"`
-	Type        NotificationType
-	Title       string
-	Message     string
-	Priority    NotificationPriority
-	Status      NotificationStatus
-	Read        bool      `gorm:"default:false"`
-	ReadAt      *time.Time
-	ActionURL   string
-	ActionLabel string
-	Metadata    map[string]string `gorm:"serializer:json"`
-	ExpiresAt   *time.Time
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	ID          uuid.UUID            `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	UserID      uuid.UUID            `gorm:"type:uuid;index" json:"userId"`
+	Type        NotificationType     `json:"type"`
+	Title       string               `json:"title"`
+	Message     string               `json:"message"`
+	Priority    NotificationPriority `json:"priority"`
+	Status      NotificationStatus   `json:"status"`
+	Source      NotificationSource   `gorm:"size:30;index" json:"source"`
+	Read        bool                 `gorm:"default:false" json:"read"`
+	ReadAt      *time.Time           `json:"readAt,omitempty"`
+	Archived    bool                 `gorm:"default:false" json:"archived"`
+	ArchivedAt  *time.Time           `json:"archivedAt,omitempty"`
+	ActionURL   string               `json:"actionUrl,omitempty"`
+	ActionLabel string               `json:"actionLabel,omitempty"`
+	Metadata    map[string]string    `gorm:"serializer:json" json:"metadata,omitempty"`
+	ExpiresAt   *time.Time           `json:"expiresAt,omitempty"`
+	CreatedAt   time.Time            `json:"createdAt"`
+	UpdatedAt   time.Time            `json:"updatedAt"`
+}
+
+// Bulk actions on notifications
+const (
+	NotificationActionRead      = "read"
+	NotificationActionUnread    = "unread"
+	NotificationActionArchive   = "archive"
+	NotificationActionUnarchive = "unarchive"
+	NotificationActionDelete    = "delete"
+)
+
+// NotificationFilter selects a page of a user's notifications
+type NotificationFilter struct {
+	Search     string // Words of the title or message
+	Sources    []NotificationSource
+	Types      []NotificationType
+	Priorities []NotificationPriority
+	Read       *bool
+	Archived   bool   // Archived notifications instead of the others
+	Cursor     string // NextCursor of the previous page
+	Limit      int
 }
 
+// NotificationPage is a page of notifications, newest first. NextCursor is
+// empty on the last page.
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	NextCursor    string         `json:"nextCursor,omitempty"`
+}
+
+// NotificationBulkRequest applies an action to several notifications
+type NotificationBulkRequest struct {
+	Action string      `json:"action"`
+	IDs    []uuid.UUID `json:"ids"`
+}
+
+// NotificationsUpdate is the data of a notification.updated event, letting the
+// user's other sessions follow read and archive changes. IDs is empty when the
+// action applied to all notifications.
+type NotificationsUpdate struct {
+	Action      string      `json:"action"`
+	IDs         []uuid.UUID `json:"ids,omitempty"`
+	UnreadCount int64       `json:"unreadCount"`
+}
+
+// Notification digest modes of a channel
+const (
+	DigestModeOff    = "off"    // delivered as they arrive
+	DigestModeHourly = "hourly" // batched into one digest an hour
+	DigestModeDaily  = "daily"  // batched into one digest a day, at DigestHour
+)
+
+// Notification channels that can be digested
+const (
+	NotificationChannelWeb   = "web"
+	NotificationChannelEmail = "email"
+)
+
 // NotificationPreference represents user notification preferences
 type NotificationPreference struct {
-	ID              uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
-	UserID          uuid.UUID `gorm:"type:uuid;index"`
-	EmailEnabled    bool `gorm:"default:true"`
-	WebEnabled      bool `gorm:"default:true"`
-	PushEnabled     bool `gorm:"default:false"`
-	AlertTypes      []NotificationType `gorm:"type:text[]"`
-	MinPriority     NotificationPriority `gorm:"default:low"`
-	QuietHoursStart string // Format: "HH:MM"
-	QuietHoursEnd   string // Format: "HH:MM"`
-	Timezone        string `gorm:"default:'UTC'"`
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
+	ID              uuid.UUID            `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	UserID          uuid.UUID            `gorm:"type:uuid;index" json:"userId"`
+	EmailEnabled    bool                 `gorm:"default:true" json:"emailEnabled"`
+	WebEnabled      bool                 `gorm:"default:true" json:"webEnabled"`
+	PushEnabled     bool                 `gorm:"default:false" json:"pushEnabled"`
+	AlertTypes      []NotificationType   `gorm:"type:text[]" json:"alertTypes"`
+	MinPriority     NotificationPriority `gorm:"default:low" json:"minPriority"`
+	QuietHoursStart string               `json:"quietHoursStart"` // Format: "HH:MM"
+	QuietHoursEnd   string               `json:"quietHoursEnd"`   // Format: "HH:MM"
+	Timezone        string               `gorm:"default:'UTC'" json:"timezone"`
+
+	// Digests. Notifications below ImmediatePriority are batched per channel,
+	// and those arriving in quiet hours are held until they end; notifications
+	// at or above it are always delivered at once.
+	WebDigest         string               `gorm:"size:10;default:off" json:"webDigest"`
+	EmailDigest       string               `gorm:"size:10;default:off" json:"emailDigest"`
+	DigestHour        int                  `gorm:"default:9" json:"digestHour"` // local hour of daily digests
+	ImmediatePriority NotificationPriority `gorm:"default:critical" json:"immediatePriority"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// DigestMode returns the digest mode of a channel
+func (p *NotificationPreference) DigestMode(channel string) string {
+	mode := p.WebDigest
+	if channel == NotificationChannelEmail {
+		mode = p.EmailDigest
+	}
+	if mode == "" {
+		return DigestModeOff
+	}
+	return mode
+}
+
+// NotificationDigestItem is a notification waiting for the next digest of a
+// channel, or for the end of quiet hours
+type NotificationDigestItem struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID         uuid.UUID `gorm:"type:uuid;not null;index:idx_notification_digest_due" json:"userId"`
+	Channel        string    `gorm:"size:20;not null;index:idx_notification_digest_due" json:"channel"`
+	NotificationID uuid.UUID `gorm:"type:uuid;not null;index" json:"notificationId"`
+	// Immediate email is sent on the next pass, ignoring digests and quiet hours
+	Immediate bool      `gorm:"default:false" json:"immediate"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// TableName specifies the table name for NotificationDigestItem
+func (NotificationDigestItem) TableName() string {
+	return "notification_digest_items"
+}
+
+// NotificationDigestPreview shows which of the recent notifications a
+// preference would have delivered at once, digested or held for quiet hours
+type NotificationDigestPreview struct {
+	Since    time.Time                             `json:"since"`
+	Channels map[string]NotificationChannelPreview `json:"channels"`
+	Items    []NotificationPreviewItem             `json:"items"`
+}
+
+// NotificationChannelPreview counts the outcomes of one channel
+type NotificationChannelPreview struct {
+	Mode         string     `json:"mode"`
+	Immediate    int        `json:"immediate"`
+	Digested     int        `json:"digested"`
+	QuietHours   int        `json:"quietHours"`
+	Skipped      int        `json:"skipped"` // disabled channel, type or priority
+	NextDigestAt *time.Time `json:"nextDigestAt,omitempty"`
+}
+
+// Outcomes of a notification on a channel in a preview
+const (
+	NotificationOutcomeImmediate  = "immediate"
+	NotificationOutcomeDigest     = "digest"
+	NotificationOutcomeQuietHours = "quiet_hours"
+	NotificationOutcomeSkipped    = "skipped"
+)
+
+// NotificationPreviewItem is the outcome of one notification per channel:
+// immediate, digest, quiet_hours or skipped
+type NotificationPreviewItem struct {
+	NotificationID uuid.UUID            `json:"notificationId"`
+	Title          string               `json:"title"`
+	Type           NotificationType     `json:"type"`
+	Priority       NotificationPriority `json:"priority"`
+	CreatedAt      time.Time            `json:"createdAt"`
+	Channels       map[string]string    `json:"channels"`
 }
 
 // NotificationDeliveryLog represents notification delivery logs
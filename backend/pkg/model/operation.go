@@ -0,0 +1,81 @@
+// Package model provides data models for long-running operations
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OperationKind is the kind of work an operation runs
+type OperationKind string
+
+const (
+	OperationHostScan          OperationKind = "host.scan"
+	OperationBatchTaskExecute  OperationKind = "batch_task.execute"
+	OperationGrafanaSync       OperationKind = "grafana.sync"
+	OperationNetworkDiagnostic OperationKind = "network.diagnostic"
+	OperationNodeDrain         OperationKind = "node.drain"
+)
+
+// OperationStatus is the state of an operation
+type OperationStatus string
+
+const (
+	OperationPending   OperationStatus = "pending"
+	OperationRunning   OperationStatus = "running"
+	OperationSucceeded OperationStatus = "succeeded"
+	OperationFailed    OperationStatus = "failed"
+	OperationCancelled OperationStatus = "cancelled"
+)
+
+// Done reports whether the operation has finished, one way or another
+func (s OperationStatus) Done() bool {
+	return s == OperationSucceeded || s == OperationFailed || s == OperationCancelled
+}
+
+// Operation tracks work that outlives the request that started it. Requests
+// starting one answer 202 Accepted with the operation, which is then polled
+// until it is done.
+type Operation struct {
+	ID              uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID          uuid.UUID       `json:"userId" gorm:"type:uuid;not null;index"`
+	Type            OperationKind   `json:"type" gorm:"type:varchar(50);not null;index"`
+	Status          OperationStatus `json:"status" gorm:"type:varchar(20);not null;index"`
+	Progress        int             `json:"progress" gorm:"not null;default:0"` // Percent done, 0 to 100
+	Message         string          `json:"message,omitempty" gorm:"type:text"` // What the operation is doing now
+	ResourceType    string          `json:"resourceType,omitempty" gorm:"type:varchar(50)"`
+	ResourceID      *uuid.UUID      `json:"resourceId,omitempty" gorm:"type:uuid;index"` // The scan task, batch task, ... the operation works on
+	Result          json.RawMessage `json:"result,omitempty" gorm:"type:jsonb"`          // What the work produced, once it succeeded
+	Error           string          `json:"error,omitempty" gorm:"type:text"`
+	Cancellable     bool            `json:"cancellable" gorm:"not null;default:false"`
+	CancelRequested bool            `json:"cancelRequested" gorm:"not null;default:false"`
+	StartedAt       *time.Time      `json:"startedAt,omitempty"`
+	CompletedAt     *time.Time      `json:"completedAt,omitempty"`
+	HeartbeatAt     *time.Time      `json:"-" gorm:"index"` // Refreshed by the instance running the operation
+	CreatedAt       time.Time       `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time       `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for Operation
+func (Operation) TableName() string {
+	return "operations"
+}
+
+// OperationAccepted is the body of the 202 response of a request that started an
+// operation; Location is where it is polled
+type OperationAccepted struct {
+	OperationID uuid.UUID       `json:"operationId"`
+	Status      OperationStatus `json:"status"`
+	Location    string          `json:"location"`
+	Operation   *Operation      `json:"operation"`
+}
+
+// OperationFilter narrows the operations a user lists
+type OperationFilter struct {
+	Type       OperationKind
+	Status     OperationStatus
+	ResourceID *uuid.UUID
+	Active     bool // Only pending and running operations
+}
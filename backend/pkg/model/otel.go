@@ -28,11 +28,38 @@ const (
 	CollectorTypeAll     CollectorType = "all"     // Collects everything
 )
 
+// CollectorMode represents where and how a collector is deployed
+type CollectorMode string
+
+const (
+	CollectorModeDeployment CollectorMode = "deployment" // Gateway Deployment in a linked cluster
+	CollectorModeDaemonSet  CollectorMode = "daemonset"  // Node agent DaemonSet in a linked cluster
+	CollectorModeSystemd    CollectorMode = "systemd"    // systemd unit on a host, managed by the agent
+)
+
+// IsValid reports whether the mode is supported
+func (m CollectorMode) IsValid() bool {
+	switch m {
+	case CollectorModeDeployment, CollectorModeDaemonSet, CollectorModeSystemd:
+		return true
+	}
+	return false
+}
+
+// Agent command types for systemd collectors
+const (
+	AgentCommandOtelApply  AgentCommandType = "otel_collector_apply"
+	AgentCommandOtelRemove AgentCommandType = "otel_collector_remove"
+	AgentCommandOtelStatus AgentCommandType = "otel_collector_status"
+)
+
 // OtelCollector represents an OpenTelemetry collector deployment
 type OtelCollector struct {
 	ID          uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
 	UserID      uuid.UUID       `json:"userId" gorm:"type:uuid;not null;index"`
-	ClusterID   uuid.UUID       `json:"clusterId" gorm:"type:uuid;not null;index"`
+	ClusterID   *uuid.UUID      `json:"clusterId,omitempty" gorm:"type:uuid;index"` // Kubernetes modes
+	HostID      *uuid.UUID      `json:"hostId,omitempty" gorm:"type:uuid;index"`    // systemd mode
+	Mode        CollectorMode   `json:"mode" gorm:"type:varchar(20);not null;default:'deployment'"`
 	Name        string          `json:"name" gorm:"type:varchar(255);not null"`
 	Namespace   string          `json:"namespace" gorm:"type:varchar(255);not null;default:'observability'"`
 	Type        CollectorType  `json:"type" gorm:"type:varchar(20);not null;default:'all'"`
@@ -41,6 +68,9 @@ type OtelCollector struct {
 
 	// Configuration
 	Config      string          `json:"-" gorm:"type:text"` // YAML configuration (encrypted if sensitive)
+	Pipeline    string          `json:"pipeline,omitempty" gorm:"type:text"` // JSON PipelineSpec the config is rendered from
+	ConfigHash  string          `json:"configHash" gorm:"type:varchar(64)"` // Hash of the deployed config
+	Image       string          `json:"image,omitempty" gorm:"type:varchar(500)"`
 	Replicas    int32           `json:"replicas" gorm:"type:int;default:1"`
 	Resources   string          `json:"resources" gorm:"type:text"` // JSON for resource limits/requests
 
@@ -58,6 +88,7 @@ type OtelCollector struct {
 	UpdatedAt   time.Time `json:"updatedAt" gorm:"type:timestamp;autoUpdateTime"`
 	// Relations
 	Cluster     *K8sCluster `json:"cluster,omitempty" gorm:"foreigner:ClusterID"`
+	Host        *Host       `json:"host,omitempty" gorm:"foreignKey:HostID"`
 	User        *User       `json:"user,omitempty" gorm:"foreigner:UserID"`
 }
 
@@ -87,9 +118,70 @@ type CollectorConfig struct {
 	} `json:"service"`
 }
 
+// PipelineSpec is a structured collector configuration. Components are keyed by
+// their ID (type or type/name) and referenced by ID from the pipelines.
+type PipelineSpec struct {
+	Receivers  map[string]map[string]interface{} `json:"receivers"`
+	Processors map[string]map[string]interface{} `json:"processors"`
+	Exporters  map[string]map[string]interface{} `json:"exporters"`
+	Extensions map[string]map[string]interface{} `json:"extensions"`
+	Pipelines  map[string]PipelineDefinition     `json:"pipelines"` // metrics, logs, traces or type/name
+}
+
+// PipelineDefinition lists the components of one pipeline in order
+type PipelineDefinition struct {
+	Receivers  []string `json:"receivers"`
+	Processors []string `json:"processors"`
+	Exporters  []string `json:"exporters"`
+}
+
+// RenderCollectorConfigRequest represents a request to render a pipeline spec
+type RenderCollectorConfigRequest struct {
+	Pipeline PipelineSpec `json:"pipeline"`
+}
+
+// ValidateCollectorConfigRequest represents a dry-run validation request for
+// either raw collector YAML or a pipeline spec
+type ValidateCollectorConfigRequest struct {
+	Config   string        `json:"config"`
+	Pipeline *PipelineSpec `json:"pipeline"`
+}
+
+// ConfigIssueSeverity represents how serious a config validation issue is
+type ConfigIssueSeverity string
+
+const (
+	ConfigIssueError   ConfigIssueSeverity = "error"   // the collector would refuse to start
+	ConfigIssueWarning ConfigIssueSeverity = "warning" // valid, but likely a mistake
+)
+
+// ConfigIssue is a single problem found in a collector config.
+// Line and Column are 1-based and zero when the position is unknown.
+type ConfigIssue struct {
+	Severity ConfigIssueSeverity `json:"severity"`
+	Line     int                 `json:"line"`
+	Column   int                 `json:"column"`
+	Path     string              `json:"path,omitempty"` // e.g. service.pipelines.traces.exporters[0]
+	Message  string              `json:"message"`
+}
+
+// ConfigValidationResult represents the outcome of validating a collector config
+type ConfigValidationResult struct {
+	Valid      bool          `json:"valid"`
+	Errors     []ConfigIssue `json:"errors"`
+	Warnings   []ConfigIssue `json:"warnings"`
+	Config     string        `json:"config,omitempty"` // rendered YAML when validating a pipeline spec
+	ConfigHash string        `json:"configHash,omitempty"`
+}
+
 // CreateCollectorRequest represents a request to create a collector
 type CreateCollectorRequest struct {
-	ClusterID        uuid.UUID      `json:"clusterId" binding:"required"`
+	ClusterID        *uuid.UUID     `json:"clusterId"`
+	HostID           *uuid.UUID     `json:"hostId"`
+	Mode             CollectorMode  `json:"mode"`
+	Pipeline         *PipelineSpec  `json:"pipeline"`
+	Image            string         `json:"image"`
+	Version          string         `json:"version"`
 	Name             string         `json:"name" binding:"required"`
 	Namespace        string         `json:"namespace" binding:"required"`
 	Type             CollectorType  `json:"type" binding:"required"`
@@ -104,6 +196,9 @@ type CreateCollectorRequest struct {
 // UpdateCollectorRequest represents a request to update a collector
 type UpdateCollectorRequest struct {
 	Config           string `json:"config"`
+	Pipeline         *PipelineSpec `json:"pipeline"`
+	Image            string `json:"image"`
+	Version          string `json:"version"`
 	Replicas         int32  `json:"replicas"`
 	Resources        string `json:"resources"`
 	MetricsEndpoint string `json:"metricsEndpoint"`
@@ -129,4 +224,9 @@ type CollectorDeploymentStatus struct {
 	ReadyReplicas int32            `json:"readyReplicas"`
 	MetricsURL    string           `json:"metricsUrl"`
 	ErrorMessage  string           `json:"errorMessage"`
+	Mode          CollectorMode    `json:"mode"`
+	ConfigHash    string           `json:"configHash"`          // Hash of the config the workload runs
+	ConfigCurrent bool             `json:"configCurrent"`       // Running config matches the stored config
+	Healthy       bool             `json:"healthy"`
+	CheckedAt     *time.Time       `json:"checkedAt,omitempty"`
 }
@@ -0,0 +1,337 @@
+// Package model provides compiled, cached permission sets for RBAC checks
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// permissionCacheTTL bounds how long a cached permission set is used. Changes made
+// on this instance invalidate the cache at once; changes made through another
+// gateway instance are picked up within the TTL.
+const permissionCacheTTL = 30 * time.Second
+
+// permissionGrant is a permission a user holds through one role assignment
+type permissionGrant struct {
+	role       string
+	scope      string
+	assignment UserRole // Only the ID, binding and expiry fields are set
+}
+
+// PermissionSet is a user's roles and access policies compiled for checking.
+// Checks against a set make no database queries.
+type PermissionSet struct {
+	UserID     uuid.UUID
+	SuperAdmin bool
+
+	grants   map[string][]permissionGrant // By resource.action
+	policies map[string][]compiledPolicy  // By resource.action, enabled only
+	tagged   map[string]bool              // resource.action keys with a policy selecting by tag
+}
+
+// compiledPolicy is an access policy with its selector parsed
+type compiledPolicy struct {
+	ResourceAccessPolicy
+	selector labels.Selector // Nil when the policy has no selector
+}
+
+// matches reports whether a policy applies to target, including its selector.
+// A selector only matches a labelled object or a resource with matching tags.
+func (p *compiledPolicy) matches(target PermissionTarget) bool {
+	if !p.appliesTo(target) {
+		return false
+	}
+	if p.selector == nil {
+		return true
+	}
+	set, ok := target.selectorLabels()
+	return ok && p.selector.Matches(set)
+}
+
+// selectorLabels returns the labels policy selectors are matched against: those
+// of the Kubernetes object acted on, or else the tags of the resource. Targets
+// that are neither have none.
+func (t PermissionTarget) selectorLabels() (labels.Set, bool) {
+	if t.Labels != nil {
+		return labels.Set(t.Labels), true
+	}
+	if t.ResourceID != nil {
+		return labels.Set(t.Tags), true
+	}
+	return nil, false
+}
+
+// ParsePolicySelector parses the selector of an access policy, either a label
+// selector such as "env=prod,team in (payments)" or the JSON of a Kubernetes
+// LabelSelector with matchLabels and matchExpressions. An empty selector
+// returns nil.
+func ParsePolicySelector(selector string) (labels.Selector, error) {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(selector, "{") {
+		return labels.Parse(selector)
+	}
+
+	var labelSelector metav1.LabelSelector
+	if err := json.Unmarshal([]byte(selector), &labelSelector); err != nil {
+		return nil, fmt.Errorf("invalid selector JSON: %w", err)
+	}
+	return metav1.LabelSelectorAsSelector(&labelSelector)
+}
+
+func permissionKey(resource, action string) string {
+	return resource + "." + action
+}
+
+// LoadPermissionSet compiles the permission set of a user from the database
+func LoadPermissionSet(db *gorm.DB, userID uuid.UUID) (*PermissionSet, error) {
+	set := &PermissionSet{
+		UserID:   userID,
+		grants:   make(map[string][]permissionGrant),
+		policies: make(map[string][]compiledPolicy),
+		tagged:   make(map[string]bool),
+	}
+
+	var userRoles []UserRole
+	if err := db.Preload("Role.RolePermissions.Permission").Where("user_id = ?", userID).Find(&userRoles).Error; err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+	for _, userRole := range userRoles {
+		role := userRole.Role
+		if role == nil {
+			continue
+		}
+		if role.Name == "super_admin" && role.IsSystem {
+			set.SuperAdmin = true
+		}
+
+		assignment := UserRole{
+			ID:           userRole.ID,
+			ResourceID:   userRole.ResourceID,
+			ResourceType: userRole.ResourceType,
+			Namespace:    userRole.Namespace,
+			ExpiresAt:    userRole.ExpiresAt,
+		}
+		for _, rolePerm := range role.RolePermissions {
+			perm := rolePerm.Permission
+			if rolePerm.Disabled || perm == nil {
+				continue
+			}
+			key := permissionKey(perm.Resource, perm.Action)
+			set.grants[key] = append(set.grants[key], permissionGrant{role: role.Name, scope: perm.Scope, assignment: assignment})
+		}
+	}
+
+	var policies []ResourceAccessPolicy
+	if err := db.Where("user_id = ? AND enabled = ?", userID, true).Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("failed to load policies: %w", err)
+	}
+	for _, policy := range policies {
+		key := permissionKey(policy.Resource, policy.Action)
+		compiled := compiledPolicy{ResourceAccessPolicy: policy}
+		selector, err := ParsePolicySelector(policy.Selector)
+		switch {
+		case err != nil && policy.Effect == PolicyEffectDeny:
+			// A deny policy whose selector cannot be read denies everywhere it
+			// otherwise applies rather than nowhere
+			compiled.selector = nil
+		case err != nil:
+			compiled.selector = labels.Nothing()
+			set.tagged[key] = true
+		case selector != nil:
+			compiled.selector = selector
+			set.tagged[key] = true
+		}
+		set.policies[key] = append(set.policies[key], compiled)
+	}
+	return set, nil
+}
+
+// SelectsByTag reports whether a policy for action on resource has a selector, so
+// checks need the tags of the target
+func (s *PermissionSet) SelectsByTag(resource, action string) bool {
+	return s.tagged[permissionKey(resource, action)]
+}
+
+// Check checks if the set allows action on resource for target. Deny policies take
+// precedence over allow policies, which take precedence over roles. Callers resolve
+// the target themselves, so cluster and host scopes only need an ID, and policies
+// with a selector only match when target.Tags or target.Labels is set; see SelectsByTag.
+func (s *PermissionSet) Check(resource, action string, target PermissionTarget) PermissionCheckResult {
+	if s.SuperAdmin {
+		return PermissionCheckResult{Allowed: true, Source: "super_admin"}
+	}
+
+	key := permissionKey(resource, action)
+	policies := s.policies[key]
+	for i := range policies {
+		if policies[i].Effect == PolicyEffectDeny && policies[i].matches(target) {
+			return PermissionCheckResult{
+				Allowed: false,
+				Reason:  fmt.Sprintf("Denied by policy: %s", policies[i].Name),
+				Source:  "policy",
+			}
+		}
+	}
+	for i := range policies {
+		if policies[i].Effect == PolicyEffectAllow && policies[i].matches(target) {
+			return PermissionCheckResult{
+				Allowed: true,
+				Reason:  fmt.Sprintf("Allowed by policy: %s", policies[i].Name),
+				Source:  "policy",
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, grant := range s.grants[key] {
+		if grant.assignment.ExpiresAt != nil && grant.assignment.ExpiresAt.Before(now) {
+			continue
+		}
+		if !grant.assignment.covers(target) {
+			continue
+		}
+
+		allowed := false
+		reason := fmt.Sprintf("Allowed by role: %s", grant.role)
+		switch grant.scope {
+		case PermissionScopeGlobal:
+			allowed = true
+		case PermissionScopeCluster:
+			allowed = target.ClusterID != nil
+		case PermissionScopeNamespace:
+			// The assignment already covers the target, it just needs to name a namespace
+			allowed = target.ClusterID != nil && target.Namespace != ""
+			reason = fmt.Sprintf("Allowed by role: %s in namespace %s", grant.role, target.Namespace)
+		case PermissionScopeHost:
+			allowed = target.ResourceID != nil
+		}
+		if allowed {
+			return PermissionCheckResult{Allowed: true, Reason: reason, Source: "role"}
+		}
+	}
+
+	return PermissionCheckResult{
+		Allowed: false,
+		Reason:  "no_permission",
+		Source:  "none",
+	}
+}
+
+// cachedPermissionSet is a permission set with the cache generation it was loaded at
+type cachedPermissionSet struct {
+	set        *PermissionSet
+	generation uint64
+	loadedAt   time.Time
+}
+
+// permissionCache holds compiled permission sets. Any role, permission or policy
+// change bumps the generation, which invalidates every cached set.
+var permissionCache = struct {
+	mu         sync.RWMutex
+	generation uint64
+	sets       map[uuid.UUID]cachedPermissionSet
+}{sets: make(map[uuid.UUID]cachedPermissionSet)}
+
+// CachedPermissionSet returns the permission set of a user, loading it if it is not
+// cached or the cached one is stale
+func CachedPermissionSet(db *gorm.DB, userID uuid.UUID) (*PermissionSet, error) {
+	permissionCache.mu.RLock()
+	generation := permissionCache.generation
+	cached, ok := permissionCache.sets[userID]
+	permissionCache.mu.RUnlock()
+	if ok && cached.generation == generation && time.Since(cached.loadedAt) < permissionCacheTTL {
+		return cached.set, nil
+	}
+
+	set, err := LoadPermissionSet(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A change made while loading bumped the generation; the set is still returned
+	// but the next check reloads it
+	permissionCache.mu.Lock()
+	permissionCache.sets[userID] = cachedPermissionSet{set: set, generation: generation, loadedAt: time.Now()}
+	permissionCache.mu.Unlock()
+	return set, nil
+}
+
+// InvalidatePermissionCache drops every cached permission set. The RBAC models call
+// it from their hooks, so only changes made with raw SQL need to call it.
+func InvalidatePermissionCache() {
+	permissionCache.mu.Lock()
+	permissionCache.generation++
+	permissionCache.sets = make(map[uuid.UUID]cachedPermissionSet)
+	permissionCache.mu.Unlock()
+}
+
+// AfterSave invalidates cached permission sets
+func (ur *UserRole) AfterSave(tx *gorm.DB) error {
+	InvalidatePermissionCache()
+	return nil
+}
+
+// AfterDelete invalidates cached permission sets
+func (ur *UserRole) AfterDelete(tx *gorm.DB) error {
+	InvalidatePermissionCache()
+	return nil
+}
+
+// AfterSave invalidates cached permission sets
+func (rp *RolePermission) AfterSave(tx *gorm.DB) error {
+	InvalidatePermissionCache()
+	return nil
+}
+
+// AfterDelete invalidates cached permission sets
+func (rp *RolePermission) AfterDelete(tx *gorm.DB) error {
+	InvalidatePermissionCache()
+	return nil
+}
+
+// AfterSave invalidates cached permission sets
+func (r *Role) AfterSave(tx *gorm.DB) error {
+	InvalidatePermissionCache()
+	return nil
+}
+
+// AfterDelete invalidates cached permission sets
+func (r *Role) AfterDelete(tx *gorm.DB) error {
+	InvalidatePermissionCache()
+	return nil
+}
+
+// AfterSave invalidates cached permission sets
+func (p *Permission) AfterSave(tx *gorm.DB) error {
+	InvalidatePermissionCache()
+	return nil
+}
+
+// AfterDelete invalidates cached permission sets
+func (p *Permission) AfterDelete(tx *gorm.DB) error {
+	InvalidatePermissionCache()
+	return nil
+}
+
+// AfterSave invalidates cached permission sets
+func (p *ResourceAccessPolicy) AfterSave(tx *gorm.DB) error {
+	InvalidatePermissionCache()
+	return nil
+}
+
+// AfterDelete invalidates cached permission sets
+func (p *ResourceAccessPolicy) AfterDelete(tx *gorm.DB) error {
+	InvalidatePermissionCache()
+	return nil
+}
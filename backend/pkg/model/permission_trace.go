@@ -0,0 +1,297 @@
+// Package model provides permission evaluation traces for debugging RBAC decisions
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PermissionTrace explains how a permission check was decided
+type PermissionTrace struct {
+	Resource   string                `json:"resource"`
+	Action     string                `json:"action"`
+	Decision   PermissionCheckResult `json:"decision"`
+	SuperAdmin bool                  `json:"superAdmin"`
+	Policies   []PolicyTrace         `json:"policies"`
+	Roles      []RoleGrantTrace      `json:"roles"`
+	// Flip is a single change that would reverse the decision, or nil if none would
+	Flip *PermissionFlip `json:"flip,omitempty"`
+}
+
+// PolicyTrace is an access policy for the checked resource and action
+type PolicyTrace struct {
+	ID      uuid.UUID `json:"id"`
+	Name    string    `json:"name"`
+	Effect  string    `json:"effect"`
+	Matched bool      `json:"matched"`
+	Won     bool      `json:"won"` // The policy decided the check
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// RoleGrantTrace is a role assignment that grants the checked resource and action
+type RoleGrantTrace struct {
+	AssignmentID uuid.UUID  `json:"assignmentId"`
+	Role         string     `json:"role"`
+	Scope        string     `json:"scope"`
+	ResourceID   *uuid.UUID `json:"resourceId,omitempty"`
+	ResourceType string     `json:"resourceType,omitempty"`
+	Namespace    string     `json:"namespace,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	Contributed  bool       `json:"contributed"` // The grant applies to the target
+	Detail       string     `json:"detail,omitempty"`
+}
+
+// PermissionFlip change kinds
+const (
+	FlipRemoveSuperAdmin = "remove_super_admin"
+	FlipDisablePolicy    = "disable_policy"
+	FlipRemoveAssignment = "remove_role_assignment"
+	FlipRenewAssignment  = "renew_role_assignment"
+	FlipAssignRole       = "assign_role"
+	FlipAddAllowPolicy   = "add_allow_policy"
+	FlipAddDenyPolicy    = "add_deny_policy"
+)
+
+// PermissionFlip is a change that would reverse a permission decision
+type PermissionFlip struct {
+	Change       string     `json:"change"`
+	Description  string     `json:"description"`
+	PolicyID     *uuid.UUID `json:"policyId,omitempty"`
+	AssignmentID *uuid.UUID `json:"assignmentId,omitempty"`
+	Role         string     `json:"role,omitempty"`
+}
+
+// Explain checks action on resource for target like Check does and records how
+// each policy and role grant took part in the decision
+func (s *PermissionSet) Explain(resource, action string, target PermissionTarget) PermissionTrace {
+	key := permissionKey(resource, action)
+	trace := PermissionTrace{
+		Resource:   resource,
+		Action:     action,
+		Decision:   s.Check(resource, action, target),
+		SuperAdmin: s.SuperAdmin,
+		Policies:   []PolicyTrace{},
+		Roles:      []RoleGrantTrace{},
+	}
+
+	// The first matching deny wins, or failing that the first matching allow
+	won := -1
+	policies := s.policies[key]
+	for _, effect := range []string{PolicyEffectDeny, PolicyEffectAllow} {
+		for i := range policies {
+			if won < 0 && policies[i].Effect == effect && policies[i].matches(target) {
+				won = i
+			}
+		}
+	}
+	for i := range policies {
+		policy := &policies[i]
+		entry := PolicyTrace{
+			ID:      policy.ID,
+			Name:    policy.Name,
+			Effect:  policy.Effect,
+			Matched: policy.matches(target),
+			Won:     i == won && !s.SuperAdmin,
+		}
+		if !entry.Matched {
+			entry.Detail = policy.mismatch(target)
+		}
+		trace.Policies = append(trace.Policies, entry)
+	}
+
+	now := time.Now()
+	for _, grant := range s.grants[key] {
+		entry := RoleGrantTrace{
+			AssignmentID: grant.assignment.ID,
+			Role:         grant.role,
+			Scope:        grant.scope,
+			ResourceID:   grant.assignment.ResourceID,
+			ResourceType: grant.assignment.ResourceType,
+			Namespace:    grant.assignment.Namespace,
+			ExpiresAt:    grant.assignment.ExpiresAt,
+		}
+		entry.Detail = grant.mismatch(target, now)
+		entry.Contributed = entry.Detail == ""
+		trace.Roles = append(trace.Roles, entry)
+	}
+
+	trace.Flip = s.flip(resource, action, target, trace.Decision.Allowed)
+	return trace
+}
+
+// mismatch says why a policy does not apply to target
+func (p *compiledPolicy) mismatch(target PermissionTarget) string {
+	switch {
+	case p.ClusterID != nil && (target.ClusterID == nil || *p.ClusterID != *target.ClusterID):
+		return fmt.Sprintf("limited to cluster %s", p.ClusterID)
+	case p.HostID != nil && (target.ResourceType != "host" || target.ResourceID == nil || *p.HostID != *target.ResourceID):
+		return fmt.Sprintf("limited to host %s", p.HostID)
+	case p.Namespace != "" && p.Namespace != target.Namespace:
+		return fmt.Sprintf("limited to namespace %s", p.Namespace)
+	}
+	if p.selector == nil {
+		return ""
+	}
+	set, ok := target.selectorLabels()
+	switch {
+	case !ok:
+		return "selects by tag, so only applies to a resource or labelled object"
+	case !p.selector.Matches(set) && target.Labels != nil:
+		return fmt.Sprintf("limited to objects labelled %s", p.selector)
+	case !p.selector.Matches(set):
+		return fmt.Sprintf("limited to resources tagged %s", p.selector)
+	}
+	return ""
+}
+
+// mismatch says why a grant does not apply to target, or returns "" if it does
+func (g *permissionGrant) mismatch(target PermissionTarget, now time.Time) string {
+	if g.assignment.ExpiresAt != nil && g.assignment.ExpiresAt.Before(now) {
+		return fmt.Sprintf("assignment expired at %s", g.assignment.ExpiresAt.Format(time.RFC3339))
+	}
+	if !g.assignment.covers(target) {
+		if g.assignment.Namespace != "" {
+			return fmt.Sprintf("assignment is bound to namespace %s of %s %s", g.assignment.Namespace, g.assignment.ResourceType, g.assignment.ResourceID)
+		}
+		return fmt.Sprintf("assignment is bound to %s %s", g.assignment.ResourceType, g.assignment.ResourceID)
+	}
+	switch g.scope {
+	case PermissionScopeCluster:
+		if target.ClusterID == nil {
+			return "cluster-scoped permission needs a cluster"
+		}
+	case PermissionScopeNamespace:
+		if target.ClusterID == nil || target.Namespace == "" {
+			return "namespace-scoped permission needs a cluster and namespace"
+		}
+	case PermissionScopeHost:
+		if target.ResourceID == nil {
+			return "host-scoped permission needs a host"
+		}
+	}
+	return ""
+}
+
+// flip finds a single change to the set that reverses the decision. Candidates are
+// tried from the most to the least specific and each is verified by re-checking.
+func (s *PermissionSet) flip(resource, action string, target PermissionTarget, allowed bool) *PermissionFlip {
+	key := permissionKey(resource, action)
+	policies := s.policies[key]
+	grants := s.grants[key]
+	flips := func(policies []compiledPolicy, grants []permissionGrant) bool {
+		candidate := &PermissionSet{
+			grants:   map[string][]permissionGrant{key: grants},
+			policies: map[string][]compiledPolicy{key: policies},
+		}
+		return candidate.Check(resource, action, target).Allowed != allowed
+	}
+
+	if allowed {
+		if s.SuperAdmin {
+			return &PermissionFlip{Change: FlipRemoveSuperAdmin, Role: "super_admin",
+				Description: "Remove the super_admin role from the user"}
+		}
+		for i := range policies {
+			if policies[i].Effect == PolicyEffectAllow && policies[i].matches(target) && flips(withoutPolicy(policies, i), grants) {
+				return &PermissionFlip{Change: FlipDisablePolicy, PolicyID: &policies[i].ID,
+					Description: fmt.Sprintf("Disable the allow policy %q", policies[i].Name)}
+			}
+		}
+		for i := range grants {
+			id := grants[i].assignment.ID
+			if grants[i].mismatch(target, time.Now()) == "" && flips(policies, withoutAssignment(grants, id)) {
+				return &PermissionFlip{Change: FlipRemoveAssignment, AssignmentID: &id, Role: grants[i].role,
+					Description: fmt.Sprintf("Remove the user's %s role assignment", grants[i].role)}
+			}
+		}
+		if flips(append(clonePolicies(policies), targetPolicy(PolicyEffectDeny, target)), grants) {
+			return &PermissionFlip{Change: FlipAddDenyPolicy,
+				Description: fmt.Sprintf("Add a deny policy for %s%s", key, targetSuffix(target))}
+		}
+		return nil
+	}
+
+	for i := range policies {
+		if policies[i].Effect == PolicyEffectDeny && policies[i].matches(target) && flips(withoutPolicy(policies, i), grants) {
+			return &PermissionFlip{Change: FlipDisablePolicy, PolicyID: &policies[i].ID,
+				Description: fmt.Sprintf("Disable the deny policy %q", policies[i].Name)}
+		}
+	}
+	for i := range grants {
+		renewed := cloneGrants(grants)
+		renewed[i].assignment.ExpiresAt = nil
+		if grants[i].assignment.ExpiresAt != nil && flips(policies, renewed) {
+			id := grants[i].assignment.ID
+			return &PermissionFlip{Change: FlipRenewAssignment, AssignmentID: &id, Role: grants[i].role,
+				Description: fmt.Sprintf("Renew the user's expired %s role assignment", grants[i].role)}
+		}
+	}
+	for i := range grants {
+		rebound := permissionGrant{role: grants[i].role, scope: grants[i].scope, assignment: targetBinding(target)}
+		if flips(policies, append(cloneGrants(grants), rebound)) {
+			return &PermissionFlip{Change: FlipAssignRole, Role: grants[i].role,
+				Description: fmt.Sprintf("Assign the %s role to the user%s", grants[i].role, targetSuffix(target))}
+		}
+	}
+	if flips(append(clonePolicies(policies), targetPolicy(PolicyEffectAllow, target)), grants) {
+		return &PermissionFlip{Change: FlipAddAllowPolicy,
+			Description: fmt.Sprintf("Add an allow policy for %s%s", key, targetSuffix(target))}
+	}
+	return nil
+}
+
+// targetBinding returns the role assignment binding that exactly covers target
+func targetBinding(target PermissionTarget) UserRole {
+	switch {
+	case target.ClusterID != nil:
+		return UserRole{ResourceID: target.ClusterID, ResourceType: "cluster", Namespace: target.Namespace}
+	case target.ResourceID != nil:
+		return UserRole{ResourceID: target.ResourceID, ResourceType: target.ResourceType}
+	}
+	return UserRole{}
+}
+
+// targetPolicy returns a policy with effect limited to exactly target
+func targetPolicy(effect string, target PermissionTarget) compiledPolicy {
+	policy := ResourceAccessPolicy{Effect: effect, ClusterID: target.ClusterID, Namespace: target.Namespace}
+	if target.ResourceType == "host" {
+		policy.HostID = target.ResourceID
+	}
+	return compiledPolicy{ResourceAccessPolicy: policy}
+}
+
+func targetSuffix(target PermissionTarget) string {
+	switch {
+	case target.ClusterID != nil && target.Namespace != "":
+		return fmt.Sprintf(" in namespace %s of cluster %s", target.Namespace, target.ClusterID)
+	case target.ClusterID != nil:
+		return fmt.Sprintf(" on cluster %s", target.ClusterID)
+	case target.ResourceID != nil:
+		return fmt.Sprintf(" on %s %s", target.ResourceType, target.ResourceID)
+	}
+	return ""
+}
+
+func clonePolicies(policies []compiledPolicy) []compiledPolicy {
+	return append([]compiledPolicy(nil), policies...)
+}
+
+func cloneGrants(grants []permissionGrant) []permissionGrant {
+	return append([]permissionGrant(nil), grants...)
+}
+
+func withoutPolicy(policies []compiledPolicy, i int) []compiledPolicy {
+	return append(clonePolicies(policies[:i]), policies[i+1:]...)
+}
+
+func withoutAssignment(grants []permissionGrant, id uuid.UUID) []permissionGrant {
+	kept := make([]permissionGrant, 0, len(grants))
+	for _, grant := range grants {
+		if grant.assignment.ID != id {
+			kept = append(kept, grant)
+		}
+	}
+	return kept
+}
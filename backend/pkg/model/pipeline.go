@@ -0,0 +1,181 @@
+// Package model provides data models for deployment pipelines: webhooks CI
+// calls with an image tag to roll it out to a deployment or Helm release, and
+// the history of their runs
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PipelineTargetType is what a pipeline rolls new tags out to
+type PipelineTargetType string
+
+const (
+	PipelineTargetDeployment PipelineTargetType = "deployment" // The image of a container of a deployment
+	PipelineTargetHelm       PipelineTargetType = "helm"       // A values key of a Helm release
+)
+
+// DeploymentPipeline rolls out the image tags CI posts to its webhook and
+// reports how the rollouts went to CI's callback URL. Requests to the webhook
+// and callbacks are signed with the pipeline's secret.
+type DeploymentPipeline struct {
+	ID                uuid.UUID          `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID            uuid.UUID          `gorm:"type:uuid;not null;index" json:"userId"`
+	Name              string             `gorm:"size:100;not null" json:"name"`
+	Description       string             `gorm:"type:text" json:"description,omitempty"`
+	ClusterID         uuid.UUID          `gorm:"type:uuid;not null;index" json:"clusterId"`
+	Namespace         string             `gorm:"size:63;not null" json:"namespace"`
+	TargetType        PipelineTargetType `gorm:"size:20;not null" json:"targetType"`
+	Deployment        string             `gorm:"size:253" json:"deployment,omitempty"`
+	Container         string             `gorm:"size:253" json:"container,omitempty"` // The deployment's only container when empty
+	ReleaseID         *uuid.UUID         `gorm:"type:uuid;index" json:"releaseId,omitempty"`
+	ValuesKey         string             `gorm:"size:255" json:"valuesKey,omitempty"`        // Dotted values key the tag is set at, image.tag by default
+	ImageRepository   string             `gorm:"size:500" json:"imageRepository,omitempty"`  // Of deployment images; the container's current one when empty
+	TagPattern        string             `gorm:"size:255" json:"tagPattern,omitempty"`       // Regular expression tags must match
+	RolloutTimeout    int                `gorm:"not null;default:600" json:"rolloutTimeout"` // Seconds a rollout has to become healthy
+	RollbackOnFailure bool               `json:"rollbackOnFailure"`
+	CallbackURL       string             `gorm:"size:2048" json:"callbackUrl,omitempty"`
+	Secret            string             `gorm:"size:255;not null" json:"-"` // HMAC-SHA256 key of webhook requests and callbacks
+	Enabled           bool               `gorm:"default:true" json:"enabled"`
+	LastTag           string             `gorm:"size:255" json:"lastTag,omitempty"`
+	LastStatus        PipelineRunStatus  `gorm:"size:20" json:"lastStatus,omitempty"`
+	LastRunAt         *time.Time         `json:"lastRunAt,omitempty"`
+	CreatedBy         string             `gorm:"size:255" json:"createdBy,omitempty"`
+	CreatedAt         time.Time          `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt         time.Time          `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// TableName specifies the table name for DeploymentPipeline
+func (DeploymentPipeline) TableName() string {
+	return "deployment_pipelines"
+}
+
+// DeploymentPipelineSecret is a pipeline with its secret, returned only when
+// the secret is set
+type DeploymentPipelineSecret struct {
+	DeploymentPipeline
+	Secret string `json:"secret"`
+}
+
+// PipelineRunTrigger is what started a run
+type PipelineRunTrigger string
+
+const (
+	PipelineTriggerWebhook PipelineRunTrigger = "webhook"
+	PipelineTriggerManual  PipelineRunTrigger = "manual"
+)
+
+// PipelineRunStatus is the outcome of a run
+type PipelineRunStatus string
+
+const (
+	PipelineRunRunning    PipelineRunStatus = "running"
+	PipelineRunSucceeded  PipelineRunStatus = "succeeded"
+	PipelineRunFailed     PipelineRunStatus = "failed"
+	PipelineRunRolledBack PipelineRunStatus = "rolled_back" // Failed, and the previous image or values were restored
+)
+
+// PipelineRollout is how a deployment a run waited for rolled out
+type PipelineRollout struct {
+	Name      string `json:"name"`
+	Replicas  int32  `json:"replicas"`
+	Updated   int32  `json:"updated"`
+	Available int32  `json:"available"`
+	Done      bool   `json:"done"`
+	Message   string `json:"message,omitempty"`
+}
+
+// DeploymentPipelineRun is a rollout of one tag by a pipeline
+type DeploymentPipelineRun struct {
+	ID             uuid.UUID          `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	PipelineID     uuid.UUID          `gorm:"type:uuid;not null;index" json:"pipelineId"`
+	Trigger        PipelineRunTrigger `gorm:"size:20;not null" json:"trigger"`
+	Tag            string             `gorm:"size:255;not null" json:"tag"`
+	Image          string             `gorm:"size:500" json:"image,omitempty"`    // The image rolled out to a deployment
+	Previous       string             `gorm:"size:500" json:"previous,omitempty"` // The image or values tag it replaced
+	Commit         string             `gorm:"size:64" json:"commit,omitempty"`    // As CI reported them
+	Ref            string             `gorm:"size:255" json:"ref,omitempty"`
+	BuildURL       string             `gorm:"size:2048" json:"buildUrl,omitempty"`
+	Status         PipelineRunStatus  `gorm:"size:20;not null;index" json:"status"`
+	Rollouts       []PipelineRollout  `gorm:"serializer:json;type:jsonb" json:"rollouts"`
+	Message        string             `gorm:"type:text" json:"message,omitempty"`
+	CallbackStatus int                `json:"callbackStatus,omitempty"` // HTTP status of the last callback
+	CallbackError  string             `gorm:"type:text" json:"callbackError,omitempty"`
+	TriggeredBy    string             `gorm:"size:255" json:"triggeredBy,omitempty"`
+	StartedAt      time.Time          `gorm:"not null" json:"startedAt"`
+	FinishedAt     *time.Time         `json:"finishedAt,omitempty"`
+}
+
+// TableName specifies the table name for DeploymentPipelineRun
+func (DeploymentPipelineRun) TableName() string {
+	return "deployment_pipeline_runs"
+}
+
+// CreateDeploymentPipelineRequest creates a pipeline. Deployment pipelines
+// name a deployment, Helm pipelines one of the user's releases.
+type CreateDeploymentPipelineRequest struct {
+	Name              string             `json:"name"`
+	Description       string             `json:"description"`
+	ClusterID         uuid.UUID          `json:"clusterId"`
+	Namespace         string             `json:"namespace"`
+	TargetType        PipelineTargetType `json:"targetType"`
+	Deployment        string             `json:"deployment"`
+	Container         string             `json:"container"`
+	ReleaseID         *uuid.UUID         `json:"releaseId"`
+	ValuesKey         string             `json:"valuesKey"`
+	ImageRepository   string             `json:"imageRepository"`
+	TagPattern        string             `json:"tagPattern"`
+	RolloutTimeout    int                `json:"rolloutTimeout"` // 600 when zero
+	RollbackOnFailure bool               `json:"rollbackOnFailure"`
+	CallbackURL       string             `json:"callbackUrl"`
+	Secret            string             `json:"secret"` // Generated when empty
+	Enabled           *bool              `json:"enabled"`
+}
+
+// UpdateDeploymentPipelineRequest changes a pipeline. Its cluster and target
+// type cannot change.
+type UpdateDeploymentPipelineRequest struct {
+	Name              *string    `json:"name"`
+	Description       *string    `json:"description"`
+	Namespace         *string    `json:"namespace"`
+	Deployment        *string    `json:"deployment"`
+	Container         *string    `json:"container"`
+	ReleaseID         *uuid.UUID `json:"releaseId"`
+	ValuesKey         *string    `json:"valuesKey"`
+	ImageRepository   *string    `json:"imageRepository"`
+	TagPattern        *string    `json:"tagPattern"`
+	RolloutTimeout    *int       `json:"rolloutTimeout"`
+	RollbackOnFailure *bool      `json:"rollbackOnFailure"`
+	CallbackURL       *string    `json:"callbackUrl"`
+	Enabled           *bool      `json:"enabled"`
+}
+
+// TriggerDeploymentPipelineRequest rolls out a tag. It is the body CI posts
+// to the webhook; the commit, ref and build URL are recorded and echoed in
+// callbacks.
+type TriggerDeploymentPipelineRequest struct {
+	Tag      string `json:"tag"`
+	Commit   string `json:"commit"`
+	Ref      string `json:"ref"`
+	BuildURL string `json:"buildUrl"`
+}
+
+// PipelineCallback is the body of the callbacks a run posts to CI when it
+// starts and when it ends
+type PipelineCallback struct {
+	PipelineID uuid.UUID         `json:"pipelineId"`
+	Pipeline   string            `json:"pipeline"`
+	RunID      uuid.UUID         `json:"runId"`
+	Status     PipelineRunStatus `json:"status"`
+	Tag        string            `json:"tag"`
+	Image      string            `json:"image,omitempty"`
+	Commit     string            `json:"commit,omitempty"`
+	Ref        string            `json:"ref,omitempty"`
+	BuildURL   string            `json:"buildUrl,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	Rollouts   []PipelineRollout `json:"rollouts"`
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt *time.Time        `json:"finishedAt,omitempty"`
+}
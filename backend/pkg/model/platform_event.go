@@ -0,0 +1,112 @@
+// Package model provides data models for platform events
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventType names a platform event published on the internal event bus
+type EventType string
+
+const (
+	EventHostAdded         EventType = "host.added"
+	EventHostDegraded      EventType = "host.degraded"
+	EventHostOffline       EventType = "host.offline"
+	EventHostOnline        EventType = "host.online"
+	EventHostLifecycle     EventType = "host.lifecycle_changed"
+	EventAlertFired        EventType = "alert.fired"
+	EventAlertResolved     EventType = "alert.resolved"
+	EventBatchTaskProgress EventType = "batch_task.progress"
+	EventBatchTaskFinished EventType = "batch_task.finished"
+	EventAnomalyDetected   EventType = "anomaly.detected"
+	EventSyncFinished      EventType = "sync.finished"
+	EventWebhookPing       EventType = "webhook.ping"
+	EventAll               EventType = "*"
+
+	EventClusterCredentialExpiring EventType = "cluster.credential_expiring"
+	EventTopologyChanged           EventType = "topology.changed"
+	EventRunbookExecuted           EventType = "runbook.executed"
+	EventNotificationDelivered     EventType = "notification.delivered"
+	EventNotificationsUpdated      EventType = "notification.updated"
+	EventOperationProgress         EventType = "operation.progress"
+	EventOperationFinished         EventType = "operation.finished"
+	EventReportGenerated           EventType = "report.generated"
+	EventCertificateExpiring       EventType = "certificate.expiring"
+	EventHelmReleaseInstalled      EventType = "helm.release_installed"
+	EventHelmReleaseUpgraded       EventType = "helm.release_upgraded"
+	EventHelmReleaseRolledBack     EventType = "helm.release_rolled_back"
+	EventAppHealthChanged          EventType = "app.health_changed"
+	EventGitOpsSynced              EventType = "gitops.synced"
+	EventPipelineRunFinished       EventType = "pipeline.run_finished"
+	EventCanaryRolloutFinished     EventType = "canary.rollout_finished"
+)
+
+// EventInfo describes an event in the catalog
+type EventInfo struct {
+	Type        EventType `json:"type"`
+	Description string    `json:"description"`
+	Attributes  []string  `json:"attributes"`           // Filterable attributes of the event
+	Permission  string    `json:"permission,omitempty"` // resource.action needed to stream the event
+}
+
+// EventCatalog lists the events that can be subscribed to
+var EventCatalog = []EventInfo{
+	{EventHostAdded, "A host was registered", []string{"hostId", "clusterId", "osType"}, "hosts.list"},
+	{EventHostDegraded, "A host's agent reports are late", []string{"hostId", "clusterId", "osType", "previousStatus"}, "hosts.list"},
+	{EventHostOffline, "A host stopped reporting", []string{"hostId", "clusterId", "osType", "previousStatus"}, "hosts.list"},
+	{EventHostOnline, "A degraded or offline host reported again", []string{"hostId", "clusterId", "osType", "previousStatus"}, "hosts.list"},
+	{EventHostLifecycle, "A host moved to another lifecycle state; the data is the host", []string{"hostId", "clusterId", "lifecycle", "previousLifecycle"}, "hosts.list"},
+	{EventAlertFired, "An alert started firing", []string{"alertId", "ruleId", "severity", "clusterId", "hostId"}, ""},
+	{EventAlertResolved, "A firing alert resolved", []string{"alertId", "ruleId", "severity", "clusterId", "hostId"}, ""},
+	{EventBatchTaskProgress, "A host of a batch task finished", []string{"taskId", "status", "type"}, ""},
+	{EventBatchTaskFinished, "A batch task completed, failed or was cancelled", []string{"taskId", "status", "type"}, ""},
+	{EventAnomalyDetected, "Anomaly detection found an anomaly", []string{"anomalyId", "ruleId", "severity", "clusterId", "hostId"}, "ai.anomaly_list"},
+	{EventSyncFinished, "A sync with an external system finished", []string{"source", "sourceId"}, ""},
+	{EventClusterCredentialExpiring, "A cluster's kubeconfig credentials are about to expire or have expired", []string{"clusterId", "level"}, "clusters.list"},
+	{EventTopologyChanged, "Part of the topology map changed; the data is the change as the user may see it", []string{"clusterId"}, ""},
+	{EventRunbookExecuted, "A runbook attached to an alert rule finished or was held back by its guardrails", []string{"runbookId", "ruleId", "alertId", "status"}, ""},
+	{EventNotificationDelivered, "A notification reached the user's notification center; the data is the notification", []string{"source", "type", "priority"}, ""},
+	{EventNotificationsUpdated, "Notifications were read, unread, archived, restored or deleted, e.g. in another session", []string{"action"}, ""},
+	{EventOperationProgress, "A long-running operation reported progress; the data is the operation", []string{"operationId", "type", "status", "resourceId"}, ""},
+	{EventOperationFinished, "A long-running operation succeeded, failed or was cancelled; the data is the operation", []string{"operationId", "type", "status", "resourceId"}, ""},
+	{EventReportGenerated, "A report was generated or failed; sent once per recipient, the data is the report without its contents", []string{"reportId", "scheduleId", "template", "status"}, "reports.view"},
+	{EventCertificateExpiring, "A monitored or discovered certificate reached a more urgent expiry status; the data is the certificate", []string{"certificateId", "source", "status", "clusterId"}, ""},
+	{EventHelmReleaseInstalled, "A Helm release was installed; the data is the change", []string{"releaseId", "clusterId", "namespace", "chart"}, "clusters.list"},
+	{EventHelmReleaseUpgraded, "A Helm release was upgraded; the data is the change, with the chart versions and the values keys that changed", []string{"releaseId", "clusterId", "namespace", "chart"}, "clusters.list"},
+	{EventHelmReleaseRolledBack, "A Helm release was rolled back to an earlier revision; the data is the change", []string{"releaseId", "clusterId", "namespace", "chart"}, "clusters.list"},
+	{EventAppHealthChanged, "An app installed from the catalog became healthy, degraded or failed; the data is the installation with its health checks", []string{"installationId", "appId", "clusterId", "status"}, "clusters.list"},
+	{EventGitOpsSynced, "A GitOps source was synced to a commit of its repository, or failed to be; the data is the sync with the objects it applied and pruned", []string{"sourceId", "clusterId", "trigger", "status"}, "clusters.list"},
+	{EventPipelineRunFinished, "A deployment pipeline run succeeded, failed or was rolled back; the data is the run with the rollouts it waited for", []string{"pipelineId", "clusterId", "trigger", "status"}, "clusters.list"},
+	{EventCanaryRolloutFinished, "A canary or blue/green rollout was promoted, rolled back or failed; the data is the rollout with its analyses", []string{"rolloutId", "clusterId", "strategy", "status"}, "clusters.list"},
+	{EventWebhookPing, "Test delivery sent on request", nil, ""},
+}
+
+// LookupEvent returns the catalog entry of an event type
+func LookupEvent(t EventType) (EventInfo, bool) {
+	for _, info := range EventCatalog {
+		if info.Type == t {
+			return info, true
+		}
+	}
+	return EventInfo{}, false
+}
+
+// IsKnownEvent reports whether t is in the catalog or is the wildcard
+func IsKnownEvent(t EventType) bool {
+	if t == EventAll {
+		return true
+	}
+	_, ok := LookupEvent(t)
+	return ok
+}
+
+// PlatformEvent is a platform event as delivered to webhooks and event streams
+type PlatformEvent struct {
+	ID         uuid.UUID         `json:"id"`
+	Type       EventType         `json:"type"`
+	OccurredAt time.Time         `json:"occurredAt"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Data       interface{}       `json:"data"`
+}
@@ -0,0 +1,59 @@
+// Package model provides data models for port-forward sessions
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PortForwardStatus represents the state of a port-forward session
+type PortForwardStatus string
+
+const (
+	PortForwardActive PortForwardStatus = "active"
+	PortForwardClosed PortForwardStatus = "closed"
+)
+
+// Reasons a port-forward session ended
+const (
+	PortForwardClosedByClient = "client_closed"
+	PortForwardClosedByPod    = "pod_closed"
+	PortForwardExpired        = "expired"
+	PortForwardTerminated     = "terminated"  // Closed through the API
+	PortForwardFailed         = "failed"      // The pod connection broke
+	PortForwardInterrupted    = "interrupted" // The gateway stopped while it was open
+)
+
+// PortForwardSession records a connection forwarded through the gateway to a pod
+// port, from when it opens until it is closed
+type PortForwardSession struct {
+	ID          uuid.UUID         `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	UserID      uuid.UUID         `json:"userId" gorm:"type:uuid;not null;index"`
+	Username    string            `json:"username" gorm:"type:varchar(255)"`
+	ClusterID   uuid.UUID         `json:"clusterId" gorm:"type:uuid;not null;index"`
+	Namespace   string            `json:"namespace" gorm:"type:varchar(255);not null"`
+	PodName     string            `json:"podName" gorm:"type:varchar(255);not null"`
+	ServiceName string            `json:"serviceName,omitempty" gorm:"type:varchar(255)"` // Set when forwarded to a service
+	Port        int32             `json:"port" gorm:"type:int;not null"`                  // Pod port the connection reaches
+	Status      PortForwardStatus `json:"status" gorm:"type:varchar(20);not null;index"`
+	CloseReason string            `json:"closeReason,omitempty" gorm:"type:varchar(20)"`
+	Error       string            `json:"error,omitempty" gorm:"type:text"`
+	BytesIn     int64             `json:"bytesIn" gorm:"type:bigint"`  // Client to pod
+	BytesOut    int64             `json:"bytesOut" gorm:"type:bigint"` // Pod to client
+	IPAddress   string            `json:"ipAddress" gorm:"type:varchar(50)"`
+	ExpiresAt   time.Time         `json:"expiresAt" gorm:"not null"`
+	CreatedAt   time.Time         `json:"createdAt" gorm:"autoCreateTime"`
+	ClosedAt    *time.Time        `json:"closedAt,omitempty"`
+}
+
+// PortForwardRequest represents a port-forward to a pod port, or to a service port
+// through one of its ready pods
+type PortForwardRequest struct {
+	ClusterID   uuid.UUID     `json:"clusterId"`
+	Namespace   string        `json:"namespace"`
+	PodName     string        `json:"podName,omitempty"`
+	ServiceName string        `json:"serviceName,omitempty"`
+	Port        int32         `json:"port"`
+	TTL         time.Duration `json:"-"` // Capped at the clusters.port_forward_ttl setting
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // PrometheusDataSource represents a Prometheus data source configuration
@@ -21,6 +22,14 @@ type PrometheusDataSource struct {
 	Password   string    `gorm:"size:255" json:"-"` // Never expose in JSON
 	Status     string    `gorm:"size:50;default:DSStatusActive" json:"status"`
 
+	// Backend compatibility
+	Flavor          string `gorm:"size:50;default:prometheus" json:"flavor"` // prometheus, thanos, victoriametrics, mimir
+	TenantID        string `gorm:"size:255" json:"tenantId,omitempty"`       // Mimir org ID, Thanos tenant or VictoriaMetrics account
+	PartialResponse bool   `gorm:"default:false" json:"partialResponse"`     // Thanos: answer when some stores fail
+
+	// Virtual data sources: the IDs of the data sources queries fan out to
+	MemberIDs pq.StringArray `gorm:"type:text[]" json:"memberIds,omitempty"`
+
 	// TLS configuration
 	InsecureSkipTLS bool   `gorm:"default:false" json:"insecureSkipTLS"`
 	CACert          string `gorm:"type:text" json:"caCert,omitempty"`
@@ -126,6 +135,28 @@ const (
 	DSStatusError    = "error"
 )
 
+// DataSource flavor constants, the Prometheus-compatible backends a data source can be
+const (
+	DSFlavorPrometheus      = "prometheus"
+	DSFlavorThanos          = "thanos"
+	DSFlavorVictoriaMetrics = "victoriametrics"
+	DSFlavorMimir           = "mimir"
+	DSFlavorVirtual         = "virtual" // Queries its member data sources and merges their series
+)
+
+// DSVirtualSourceLabel is the label naming the member data source each series of
+// a virtual data source came from
+const DSVirtualSourceLabel = "source"
+
+// IsValidDataSourceFlavor reports whether flavor is a supported backend; empty means Prometheus
+func IsValidDataSourceFlavor(flavor string) bool {
+	switch flavor {
+	case "", DSFlavorPrometheus, DSFlavorThanos, DSFlavorVictoriaMetrics, DSFlavorMimir, DSFlavorVirtual:
+		return true
+	}
+	return false
+}
+
 // Alert severity constants
 const (
 	AlertSeverityCritical = "critical"
@@ -145,6 +176,10 @@ type CreatePrometheusDataSourceRequest struct {
 	ClientCert      string     `json:"clientCert,omitempty"`
 	ClientKey       string     `json:"clientKey,omitempty"`
 	Headers         string     `json:"headers,omitempty"`
+	Flavor          string     `json:"flavor,omitempty"` // prometheus when empty
+	TenantID        string     `json:"tenantId,omitempty"`
+	PartialResponse bool       `json:"partialResponse,omitempty"`
+	MemberIDs       []uuid.UUID `json:"memberIds,omitempty"` // Virtual data sources only; URL and auth are then ignored
 }
 
 // UpdatePrometheusDataSourceRequest represents a request to update a data source
@@ -159,6 +194,10 @@ type UpdatePrometheusDataSourceRequest struct {
 	ClientKey       *string  `json:"clientKey,omitempty"`
 	Headers         *string  `json:"headers,omitempty"`
 	Status          *string  `json:"status,omitempty"`
+	Flavor          *string  `json:"flavor,omitempty"`
+	TenantID        *string  `json:"tenantId,omitempty"`
+	PartialResponse *bool    `json:"partialResponse,omitempty"`
+	MemberIDs       *[]uuid.UUID `json:"memberIds,omitempty"`
 }
 
 // TestPrometheusDataSourceRequest represents a request to test a data source
@@ -170,15 +209,25 @@ type TestPrometheusDataSourceRequest struct {
 	CACert          string `json:"caCert,omitempty"`
 	ClientCert      string `json:"clientCert,omitempty"`
 	ClientKey       string `json:"clientKey,omitempty"`
+	Headers         string `json:"headers,omitempty"`
+	Flavor          string `json:"flavor,omitempty"`
+	TenantID        string `json:"tenantId,omitempty"`
+	PartialResponse bool   `json:"partialResponse,omitempty"`
+	MemberIDs       []uuid.UUID `json:"memberIds,omitempty"` // Virtual data sources: each member is tested
 }
 
 // TestPrometheusDataSourceResponse represents the response from testing a data source
 type TestPrometheusDataSourceResponse struct {
-	Success    bool   `json:"success"`
-	Version    string `json:"version,omitempty"`
-	Message    string `json:"message"`
-	Error      string `json:"error,omitempty"`
-	Duration   int64  `json:"duration"` // milliseconds
+	Success     bool   `json:"success"`
+	Flavor      string `json:"flavor,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Application string `json:"application,omitempty"` // e.g. "Grafana Mimir"
+	Message     string `json:"message"`
+	Error       string `json:"error,omitempty"`
+	Duration    int64  `json:"duration"` // milliseconds
+
+	// Virtual data sources: the result of each member, by data source name
+	Members map[string]*TestPrometheusDataSourceResponse `json:"members,omitempty"`
 }
 
 // CreatePrometheusAlertRuleRequest represents a request to create an alert rule
@@ -208,13 +257,29 @@ type UpdatePrometheusAlertRuleRequest struct {
 	Enabled     *bool   `json:"enabled,omitempty"`
 }
 
+// PrometheusAlertRulePreviewRequest asks how an alerting expression evaluates
+// against a data source before the rule is saved
+type PrometheusAlertRulePreviewRequest struct {
+	DataSourceID uuid.UUID `json:"dataSourceId"`
+	Expression   string    `json:"expression"`
+}
+
+// PrometheusAlertRulePreview is the series an alerting expression returns now;
+// each would be pending or firing once the rule's duration has passed
+type PrometheusAlertRulePreview struct {
+	Series   []PrometheusSeries `json:"series"`
+	Warnings []string           `json:"warnings,omitempty"` // e.g. members of a virtual data source that failed
+	Duration int64              `json:"duration"`           // milliseconds
+}
+
 // PrometheusQueryRequest represents a request to query Prometheus
 type PrometheusQueryRequest struct {
-	Query     string `json:"query" binding:"required"`
-	QueryType string `json:"queryType" binding:"required,oneof=instant range"`
-	StartTime string `json:"startTime,omitempty"` // RFC3339 or relative (e.g., "1h ago")
-	EndTime   string `json:"endTime,omitempty"`   // RFC3339 or "now"
-	Step      string `json:"step,omitempty"`      // e.g., "15s", "1m"
+	Query     string       `json:"query"`             // Built from Builder when empty
+	Builder   *PromQLQuery `json:"builder,omitempty"`
+	QueryType string       `json:"queryType" binding:"required,oneof=instant range"`
+	StartTime string       `json:"startTime,omitempty"` // RFC3339 or relative (e.g., "1h ago")
+	EndTime   string       `json:"endTime,omitempty"`   // RFC3339 or "now"
+	Step      string       `json:"step,omitempty"`      // e.g., "15s", "1m"
 }
 
 // PrometheusQueryResponse represents the response from a Prometheus query
@@ -222,14 +287,35 @@ type PrometheusQueryResponse struct {
 	Status   string        `json:"status"`
 	Data     []PrometheusSeries `json:"data,omitempty"`
 	Error    string        `json:"error,omitempty"`
+	Warnings []string      `json:"warnings,omitempty"` // e.g. a Thanos partial response
 	Duration int64         `json:"duration"` // milliseconds
 }
 
-// PrometheusSeries represents a single time series
+// PrometheusSeries represents a single time series. Native histograms come as
+// Histogram and Histograms instead of Value and Values.
 type PrometheusSeries struct {
-	Metric map[string]string `json:"metric"`
-	Values []PrometheusValue  `json:"values,omitempty"`
-	Value  *PrometheusValue   `json:"value,omitempty"`
+	Metric     map[string]string     `json:"metric"`
+	Values     []PrometheusValue     `json:"values,omitempty"`
+	Value      *PrometheusValue      `json:"value,omitempty"`
+	Histograms []PrometheusHistogram `json:"histograms,omitempty"`
+	Histogram  *PrometheusHistogram  `json:"histogram,omitempty"`
+}
+
+// PrometheusHistogram is a native histogram sample
+type PrometheusHistogram struct {
+	Timestamp float64                     `json:"timestamp"`
+	Count     string                      `json:"count"`
+	Sum       string                      `json:"sum"`
+	Buckets   []PrometheusHistogramBucket `json:"buckets,omitempty"`
+}
+
+// PrometheusHistogramBucket is a bucket of a native histogram. Boundaries tells
+// which ends are inclusive: 0 the upper, 1 the lower, 2 neither and 3 both.
+type PrometheusHistogramBucket struct {
+	Boundaries int    `json:"boundaries"`
+	Lower      string `json:"lower"`
+	Upper      string `json:"upper"`
+	Count      string `json:"count"`
 }
 
 // PrometheusValue represents a single value at a timestamp
@@ -0,0 +1,82 @@
+// Package model provides Prometheus query history and saved query models
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PrometheusSavedQuery is a named query a user keeps to run again
+type PrometheusSavedQuery struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	UserID       uuid.UUID `gorm:"type:uuid;not null;index:idx_prometheus_saved_query_user_id" json:"userId"`
+	DataSourceID uuid.UUID `gorm:"type:uuid;not null;index:idx_prometheus_saved_query_datasource_id" json:"dataSourceId"`
+	Name         string    `gorm:"size:255;not null" json:"name"`
+	Description  string    `gorm:"type:text" json:"description,omitempty"`
+	Query        string    `gorm:"type:text;not null" json:"query"`
+	QueryType    string    `gorm:"size:50;not null" json:"queryType"`   // instant, range
+	StartTime    string    `gorm:"size:100" json:"startTime,omitempty"` // Kept as given, e.g. "now-1h"
+	EndTime      string    `gorm:"size:100" json:"endTime,omitempty"`
+	Step         string    `gorm:"size:50" json:"step,omitempty"`
+	Starred      bool      `gorm:"default:false" json:"starred"`
+
+	RunCount  int        `gorm:"default:0" json:"runCount"`
+	LastRunAt *time.Time `json:"lastRunAt,omitempty"`
+}
+
+// TableName specifies the table name for PrometheusSavedQuery
+func (PrometheusSavedQuery) TableName() string {
+	return "prometheus_saved_queries"
+}
+
+// PrometheusQueryHistoryFilter selects entries of a user's query history
+type PrometheusQueryHistoryFilter struct {
+	DataSourceID *uuid.UUID
+	Success      *bool
+	QueryType    string
+	Search       string // Substring of the query
+	MinDuration  int64  // milliseconds
+	MaxDuration  int64  // milliseconds; 0 is unbounded
+	Since        time.Time
+	Until        time.Time
+	Limit        int
+	Offset       int
+}
+
+// SavePrometheusQueryRequest saves a query, given in full or as a history entry
+type SavePrometheusQueryRequest struct {
+	HistoryID    *uuid.UUID `json:"historyId,omitempty"` // Copies the query of this history entry
+	DataSourceID *uuid.UUID `json:"dataSourceId,omitempty"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description,omitempty"`
+	Query        string     `json:"query,omitempty"`
+	QueryType    string     `json:"queryType,omitempty"` // instant when empty
+	StartTime    string     `json:"startTime,omitempty"`
+	EndTime      string     `json:"endTime,omitempty"`
+	Step         string     `json:"step,omitempty"`
+	Starred      bool       `json:"starred,omitempty"`
+}
+
+// UpdatePrometheusSavedQueryRequest changes the given fields of a saved query
+type UpdatePrometheusSavedQueryRequest struct {
+	DataSourceID *uuid.UUID `json:"dataSourceId,omitempty"`
+	Name         *string    `json:"name,omitempty"`
+	Description  *string    `json:"description,omitempty"`
+	Query        *string    `json:"query,omitempty"`
+	QueryType    *string    `json:"queryType,omitempty"`
+	StartTime    *string    `json:"startTime,omitempty"`
+	EndTime      *string    `json:"endTime,omitempty"`
+	Step         *string    `json:"step,omitempty"`
+	Starred      *bool      `json:"starred,omitempty"`
+}
+
+// RunPrometheusSavedQueryRequest overrides the time range a saved query is run over
+type RunPrometheusSavedQueryRequest struct {
+	StartTime string `json:"startTime,omitempty"`
+	EndTime   string `json:"endTime,omitempty"`
+	Step      string `json:"step,omitempty"`
+}
@@ -0,0 +1,36 @@
+// Package model provides the PromQL queries built from common patterns
+package model
+
+// PromQLQueryKind is the pattern a built query follows
+type PromQLQueryKind string
+
+const (
+	PromQLRate     PromQLQueryKind = "rate"     // sum by (...) (rate(metric[window]))
+	PromQLIncrease PromQLQueryKind = "increase" // sum by (...) (increase(metric[window]))
+	PromQLQuantile PromQLQueryKind = "quantile" // histogram_quantile over the summed rate of a histogram
+	PromQLAverage  PromQLQueryKind = "average"  // Mean observation of a histogram: rate of its sum over rate of its count
+)
+
+// PromQLQuery is a query built from a common pattern rather than written by
+// hand, so panels can ask for a percentile without getting le and _bucket right
+type PromQLQuery struct {
+	Kind     PromQLQueryKind `json:"kind"`
+	Metric   string          `json:"metric"` // A counter, or a histogram's name without _bucket, _sum or _count
+	Matchers []PromQLMatcher `json:"matchers,omitempty"`
+	By       []string        `json:"by,omitempty"`       // Labels to keep; none sums everything
+	Window   string          `json:"window,omitempty"`   // Range of rate(), e.g. 5m; $__rate_interval by default
+	Quantile float64         `json:"quantile,omitempty"` // 0 to 1, quantile queries only
+	Native   bool            `json:"native,omitempty"`   // The metric is a native histogram, without _bucket series
+}
+
+// PromQLMatcher selects series by a label
+type PromQLMatcher struct {
+	Label string `json:"label"`
+	Op    string `json:"op,omitempty"` // =, !=, =~ or !~; = by default
+	Value string `json:"value"`
+}
+
+// PromQLBuildResult is the expression a PromQLQuery builds
+type PromQLBuildResult struct {
+	Expr string `json:"expr"`
+}
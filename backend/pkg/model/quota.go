@@ -0,0 +1,95 @@
+// Package model provides usage quota models
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Quota resources
+const (
+	QuotaResourceClusters     = "clusters"
+	QuotaResourceHosts        = "hosts"
+	QuotaResourceDataSources  = "data_sources" // Prometheus, log and trace data sources together
+	QuotaResourceDashboards   = "dashboards"
+	QuotaResourceLLMTokens    = "llm_tokens"    // Tokens used this calendar month
+	QuotaResourcePortForwards = "port_forwards" // Sessions open at the same time
+	QuotaResourceStagedBytes  = "staged_bytes"  // Size of the files staged for distribution
+)
+
+// QuotaResources lists every resource a quota can limit
+var QuotaResources = []string{
+	QuotaResourceClusters,
+	QuotaResourceHosts,
+	QuotaResourceDataSources,
+	QuotaResourceDashboards,
+	QuotaResourceLLMTokens,
+	QuotaResourcePortForwards,
+	QuotaResourceStagedBytes,
+}
+
+// Quota scopes. There is no organization entity, so an org is the set of users
+// sharing a department.
+const (
+	QuotaScopeUser = "user"
+	QuotaScopeOrg  = "org"
+)
+
+// ResourceQuota limits how much of a resource a user or org may use. A user quota
+// overrides the default per-user limit in the settings; an org quota limits the
+// total of all its users.
+type ResourceQuota struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Scope     string     `gorm:"size:20;not null;uniqueIndex:idx_resource_quota_subject" json:"scope"`
+	Subject   string     `gorm:"size:255;not null;uniqueIndex:idx_resource_quota_subject" json:"subject"` // User ID or department
+	Resource  string     `gorm:"size:50;not null;uniqueIndex:idx_resource_quota_subject" json:"resource"`
+	Limit     int64      `gorm:"column:quota_limit;not null" json:"limit"` // 0 forbids the resource
+	Soft      bool       `gorm:"default:false" json:"soft"`                // Exceeding warns instead of blocking
+	CreatedBy *uuid.UUID `gorm:"type:uuid" json:"createdBy,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// TableName specifies the table name for ResourceQuota
+func (ResourceQuota) TableName() string {
+	return "resource_quotas"
+}
+
+// SetQuotaRequest sets the quota of a user or org on a resource
+type SetQuotaRequest struct {
+	Scope    string `json:"scope"`
+	Subject  string `json:"subject"`
+	Resource string `json:"resource"`
+	Limit    int64  `json:"limit"`
+	Soft     bool   `json:"soft"`
+}
+
+// ResourceUsage is the use of a resource against its limit. A nil limit is unlimited.
+type ResourceUsage struct {
+	Used  int64  `json:"used"`
+	Limit *int64 `json:"limit,omitempty"`
+	Soft  bool   `json:"soft,omitempty"`
+}
+
+// UserUsage is what a user consumes
+type UserUsage struct {
+	UserID     uuid.UUID                `json:"userId"`
+	Username   string                   `json:"username"`
+	Department string                   `json:"department,omitempty"`
+	Resources  map[string]ResourceUsage `json:"resources"`
+}
+
+// OrgUsage is what the users of an org consume together
+type OrgUsage struct {
+	Org       string                   `json:"org"`
+	Users     int                      `json:"users"`
+	Resources map[string]ResourceUsage `json:"resources"`
+}
+
+// UsageSummary is the consumption of every user and org
+type UsageSummary struct {
+	PeriodStart time.Time   `json:"periodStart"` // Start of the LLM token period
+	Users       []UserUsage `json:"users"`
+	Orgs        []OrgUsage  `json:"orgs"`
+}
@@ -90,6 +90,7 @@ type UserRole struct {
 	// If set, this role only applies to the specified resource
 	ResourceID   *uuid.UUID `gorm:"type:uuid" json:"resourceId,omitempty"`
 	ResourceType string     `gorm:"size:50" json:"resourceType,omitempty"` // cluster, host, etc.
+	Namespace    string     `gorm:"size:253" json:"namespace,omitempty"`   // With a cluster resource, limits the role to this namespace
 	ExpiresAt     *time.Time `json:"expiresAt,omitempty"` // Temporary role assignment
 
 	// Relationships
@@ -106,6 +107,7 @@ type ResourceAccessPolicy struct {
 	UserID    uuid.UUID `gorm:"type:uuid;not null;index:idx_resource_policy_user_id" json:"userId"`
 	ClusterID *uuid.UUID `gorm:"type:uuid;index:idx_resource_policy_cluster_id" json:"clusterId,omitempty"`
 	HostID    *uuid.UUID `gorm:"type:uuid;index:idx_resource_policy_host_id" json:"hostId,omitempty"`
+	Namespace string     `gorm:"size:253" json:"namespace,omitempty"` // Limits the policy to this namespace
 
 	// Policy details
 	Name       string    `gorm:"size:255;not null" json:"name"`
@@ -154,6 +156,7 @@ type AssignRoleRequest struct {
 	RoleID       uuid.UUID  `json:"roleId" binding:"required"`
 	ResourceID   *uuid.UUID `json:"resourceId,omitempty"`
 	ResourceType string     `json:"resourceType,omitempty"`
+	Namespace    string     `json:"namespace,omitempty"`
 	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
 }
 
@@ -182,6 +185,19 @@ type CheckPermissionRequest struct {
 	Action      string `json:"action" binding:"required"`
 	ResourceID   *uuid.UUID `json:"resourceId,omitempty"`
 	ResourceType string     `json:"resourceType,omitempty"`
+	Namespace    string     `json:"namespace,omitempty"` // Checks in a namespace of the cluster in resourceId
+	Labels       map[string]string `json:"labels,omitempty"` // Checks against a Kubernetes object with these labels
+}
+
+// Target returns what the permission is checked against
+func (req *CheckPermissionRequest) Target() PermissionTarget {
+	target := PermissionTarget{ResourceID: req.ResourceID, ResourceType: req.ResourceType}
+	if req.ResourceType == "cluster" {
+		target.ClusterID = req.ResourceID
+		target.Namespace = req.Namespace
+	}
+	target.Labels = req.Labels
+	return target
 }
 
 // CheckPermissionResponse represents the response from a permission check
@@ -194,6 +210,7 @@ type CheckPermissionResponse struct {
 type CreateResourceAccessPolicyRequest struct {
 	ClusterID   *uuid.UUID `json:"clusterId,omitempty"`
 	HostID      *uuid.UUID `json:"hostId,omitempty"`
+	Namespace   string     `json:"namespace,omitempty"`
 	Name        string     `json:"name" binding:"required"`
 	Effect      string     `json:"effect" binding:"required,oneof=allow deny"`
 	Action      string     `json:"action" binding:"required"`
@@ -231,6 +248,28 @@ type PermissionSummary struct {
 	Scope       string `json:"scope"`
 }
 
+// NamespaceBinding grants a user a role in one namespace of a cluster. It is stored
+// as a cluster-scoped UserRole with the namespace set.
+type NamespaceBinding struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"userId"`
+	ClusterID uuid.UUID  `json:"clusterId"`
+	Namespace string     `json:"namespace"`
+	RoleID    uuid.UUID  `json:"roleId"`
+	RoleName  string     `json:"roleName,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// CreateNamespaceBindingRequest represents a request to grant a user access to a cluster namespace
+type CreateNamespaceBindingRequest struct {
+	UserID    uuid.UUID  `json:"userId"`
+	ClusterID uuid.UUID  `json:"clusterId"`
+	Namespace string     `json:"namespace"`
+	RoleID    uuid.UUID  `json:"roleId"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
 // ResourcePolicySummary represents a simplified resource access policy
 type ResourcePolicySummary struct {
 	ID        string `json:"id"`
@@ -266,133 +305,99 @@ func (r *Role) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// PermissionTarget is what a permission is checked against. Namespace-scoped
+// permissions only apply when both ClusterID and Namespace are set.
+type PermissionTarget struct {
+	ResourceID   *uuid.UUID
+	ResourceType string
+	ClusterID    *uuid.UUID
+	Namespace    string
+	Tags         map[string]string // Tags of the resource, loaded by CheckPermission when a policy selects by tag
+	Labels       map[string]string // Labels of the Kubernetes object acted on, matched by selectors instead of Tags
+}
+
 // UserHasPermission checks if a user has a specific permission
 // This is the main authorization function
 func UserHasPermission(db *gorm.DB, userID uuid.UUID, resource, action string, resourceID *uuid.UUID, resourceType string) PermissionCheckResult {
-	// First check if user is super admin (has a special role)
-	var adminRole Role
-	if err := db.Where("name = ? AND is_system = ?", "super_admin", true).First(&adminRole).Error; err == nil {
-		// Check if user has super admin role
-		var userRole UserRole
-		if err := db.Where("user_id = ? AND role_id = ?", userID, adminRole.ID).First(&userRole).Error; err == nil {
-			return PermissionCheckResult{Allowed: true, Source: "super_admin"}
-		}
+	target := PermissionTarget{ResourceID: resourceID, ResourceType: resourceType}
+	if resourceType == "cluster" {
+		target.ClusterID = resourceID
 	}
+	return CheckPermission(db, userID, resource, action, target)
+}
 
-	// Check direct resource access policies (deny takes precedence)
-	var policies []ResourceAccessPolicy
-	query := db.Model(&ResourceAccessPolicy{}).Where("user_id = ? AND enabled = ?", userID, true)
-
-	if resourceID != nil {
-		query = query.Where("resource_id = ?", resourceID)
-	}
-	if resourceType != "" {
-		query = query.Where("resource_type = ?", resourceType)
-	}
-	query = query.Where("resource = ? AND action = ?", resource, action)
+// UserHasNamespacePermission checks if a user has a specific permission in a namespace of a cluster
+func UserHasNamespacePermission(db *gorm.DB, userID uuid.UUID, resource, action string, clusterID uuid.UUID, namespace string) PermissionCheckResult {
+	return CheckPermission(db, userID, resource, action, PermissionTarget{
+		ResourceID:   &clusterID,
+		ResourceType: "cluster",
+		ClusterID:    &clusterID,
+		Namespace:    namespace,
+	})
+}
 
-	if err := query.Find(&policies).Error; err != nil {
-		return PermissionCheckResult{Allowed: false, Reason: "policy_check_error"}
+// UserHasObjectPermission checks if a user has a specific permission on a
+// Kubernetes object in a namespace of a cluster, such as a pod. Policy selectors
+// are matched against the labels of the object.
+func UserHasObjectPermission(db *gorm.DB, userID uuid.UUID, resource, action string, clusterID uuid.UUID, namespace string, objectLabels map[string]string) PermissionCheckResult {
+	if objectLabels == nil {
+		objectLabels = map[string]string{}
 	}
+	return CheckPermission(db, userID, resource, action, PermissionTarget{
+		ResourceID:   &clusterID,
+		ResourceType: "cluster",
+		ClusterID:    &clusterID,
+		Namespace:    namespace,
+		Labels:       objectLabels,
+	})
+}
 
-	// Check for explicit deny policies first
-	for _, policy := range policies {
-		if policy.Effect == PolicyEffectDeny {
-			return PermissionCheckResult{
-				Allowed: false,
-				Reason:  fmt.Sprintf("Denied by policy: %s", policy.Name),
-				Source:  "policy",
-			}
-		}
+// CheckPermission checks if a user may perform action on resource for target.
+// Deny policies take precedence over allow policies, which take precedence over roles.
+// The user's permissions are loaded once and cached; see PermissionSet. The tags
+// of the target are only read when one of the user's policies selects by tag and
+// the target is not a labelled Kubernetes object.
+func CheckPermission(db *gorm.DB, userID uuid.UUID, resource, action string, target PermissionTarget) PermissionCheckResult {
+	set, err := CachedPermissionSet(db, userID)
+	if err != nil {
+		return PermissionCheckResult{Allowed: false, Reason: "permission_check_error"}
 	}
-
-	// Check for explicit allow policies
-	for _, policy := range policies {
-		if policy.Effect == PolicyEffectAllow {
-			return PermissionCheckResult{
-				Allowed: true,
-				Reason:  fmt.Sprintf("Allowed by policy: %s", policy.Name),
-				Source:  "policy",
-			}
+	if target.Tags == nil && target.Labels == nil && !set.SuperAdmin && set.SelectsByTag(resource, action) {
+		tags, err := PermissionTargetTags(db, target)
+		if err != nil {
+			return PermissionCheckResult{Allowed: false, Reason: "permission_check_error"}
 		}
+		target.Tags = tags
 	}
+	return set.Check(resource, action, target)
+}
 
-	// Check role-based permissions
-	// Get all roles assigned to the user
-	var userRoles []UserRole
-	if err := db.Preload("Role.RolePermissions.Permission").Where("user_id = ?", userID).Find(&userRoles).Error; err != nil {
-		return PermissionCheckResult{Allowed: false, Reason: "role_check_error"}
+// covers reports whether a role assignment applies to target. Unbound assignments
+// apply everywhere; a cluster assignment applies to the whole cluster, or only to
+// its namespace if one is set.
+func (ur *UserRole) covers(target PermissionTarget) bool {
+	if ur.ResourceID == nil {
+		return true
 	}
-
-	for _, userRole := range userRoles {
-		// Check if role assignment is expired
-		if userRole.ExpiresAt != nil && userRole.ExpiresAt.Before(time.Now()) {
-			continue
-		}
-
-		role := userRole.Role
-		if role == nil {
-			continue
-		}
-
-		// Check all permissions in the role
-		for _, rolePerm := range role.RolePermissions {
-			if rolePerm.Disabled {
-				continue
-			}
-
-			perm := rolePerm.Permission
-			if perm == nil {
-				continue
-			}
-
-			// Check if permission matches the request
-			if perm.Resource == resource && perm.Action == action {
-				// Check scope
-				switch perm.Scope {
-				case PermissionScopeGlobal:
-					return PermissionCheckResult{
-						Allowed: true,
-						Reason:  fmt.Sprintf("Allowed by role: %s", role.Name),
-						Source:  "role",
-					}
-				case PermissionScopeCluster:
-					// Check if resourceID matches cluster
-					if resourceID != nil {
-						var cluster Cluster
-						if err := db.Where("id = ?", resourceID).First(&cluster).Error; err == nil {
-							return PermissionCheckResult{
-								Allowed: true,
-								Reason:  fmt.Sprintf("Allowed by role: %s", role.Name),
-								Source:  "role",
-							}
-						}
-					}
-				case PermissionScopeNamespace:
-					// Would need to check namespace membership
-					// For now, return false as namespace-scoped permissions need cluster context
-				case PermissionScopeHost:
-					// Check if resourceID matches host
-					if resourceID != nil {
-						var host Host
-						if err := db.Where("id = ?", resourceID).First(&host).Error; err == nil {
-							return PermissionCheckResult{
-								Allowed: true,
-								Reason:  fmt.Sprintf("Allowed by role: role: %s", role.Name),
-								Source:  "role",
-							}
-						}
-					}
-				}
-			}
+	if ur.ResourceType == "cluster" {
+		if target.ClusterID == nil || *target.ClusterID != *ur.ResourceID {
+			return false
 		}
+		return ur.Namespace == "" || ur.Namespace == target.Namespace
 	}
+	return target.ResourceID != nil && *target.ResourceID == *ur.ResourceID && target.ResourceType == ur.ResourceType
+}
 
-	return PermissionCheckResult{
-		Allowed: false,
-		Reason:  "no_permission",
-		Source:  "none",
+// appliesTo reports whether a policy applies to target. Policies without a cluster,
+// host or namespace apply everywhere.
+func (p *ResourceAccessPolicy) appliesTo(target PermissionTarget) bool {
+	if p.ClusterID != nil && (target.ClusterID == nil || *p.ClusterID != *target.ClusterID) {
+		return false
+	}
+	if p.HostID != nil && (target.ResourceType != "host" || target.ResourceID == nil || *p.HostID != *target.ResourceID) {
+		return false
 	}
+	return p.Namespace == "" || p.Namespace == target.Namespace
 }
 
 // GetEffectivePermissions returns all effective permissions for a user
@@ -465,6 +470,10 @@ func SeedDefaultPermissions(db *gorm.DB) error {
 	{Name: "hosts.ssh", DisplayName: "SSH Access", Category: "host", Resource: "hosts", Action: "ssh", Scope: PermissionScopeGlobal},
 		{Name: "hosts.files", DisplayName: "File Management", Category: "host", Resource: "hosts", Action: "files", Scope: PermissionScopeGlobal},
 	{Name: "hosts.processes", DisplayName: "Process Management", Category: "host", Resource: "hosts", Action: "processes", Scope: PermissionScopeGlobal},
+		{Name: "hosts.services", DisplayName: "Service Control", Category: "host", Resource: "hosts", Action: "services", Scope: PermissionScopeGlobal},
+		{Name: "hosts.plugins", DisplayName: "Manage Agent Plugins", Category: "host", Resource: "hosts", Action: "plugins", Scope: PermissionScopeGlobal},
+		{Name: "hosts.bulk_approve", DisplayName: "Approve Bulk Host Actions", Category: "host", Resource: "hosts", Action: "bulk_approve", Scope: PermissionScopeGlobal},
+		{Name: "tasks.run", DisplayName: "Run Batch Tasks", Category: "host", Resource: "tasks", Action: "run", Scope: PermissionScopeGlobal},
 
 		// Cluster management permissions
 		{Name: "clusters.list", DisplayName: "List Clusters", Category: "k8s", Resource: "clusters", Action: "list", Scope: PermissionScopeGlobal},
@@ -473,6 +482,9 @@ func SeedDefaultPermissions(db *gorm.DB) error {
 		{Name: "clusters.update", DisplayName: "Update Clusters", Category: "k8s", Resource: "clusters", Action: "update", Scope: PermissionScopeGlobal},
 		{Name: "clusters.delete", DisplayName: "Delete Clusters", Category: "k8s", Resource: "clusters", Action: "delete", Scope: PermissionScopeGlobal},
 
+		// Node permissions
+		{Name: "nodes.maintain", DisplayName: "Cordon and Drain Nodes", Category: "k8s", Resource: "nodes", Action: "maintain", Scope: PermissionScopeCluster},
+
 		// Workload permissions
 		{Name: "workloads.list", DisplayName: "List Workloads", Category: "k8s", Resource: "workloads", Action: "list", Scope: PermissionScopeCluster},
 		{Name: "workloads.get", DisplayName: "View Workload Details", Category: "k8s", Resource: "workloads", Action: "get", Scope: PermissionScopeCluster},
@@ -485,8 +497,32 @@ func SeedDefaultPermissions(db *gorm.DB) error {
 		{Name: "pods.get", DisplayName: "View Pod Details", Category: "k8s", Resource: "pods", Action: "get", Scope: PermissionScopeNamespace},
 		{Name: "pods.logs", DisplayName: "View Pod Logs", Category: "k8s", Resource: "pods", Action: "logs", Scope: PermissionScopeNamespace},
 		{Name: "pods.terminal", DisplayName: "Pod Terminal Access", Category: "k8s", Resource: "pods", Action: "terminal", Scope: PermissionScopeNamespace},
+		{Name: "pods.portforward", DisplayName: "Pod Port Forwarding", Category: "k8s", Resource: "pods", Action: "portforward", Scope: PermissionScopeNamespace},
 		{Name: "pods.delete", DisplayName: "Delete Pods", Category: "k8s", Resource: "pods", Action: "delete", Scope: PermissionScopeNamespace},
 
+		// Deployment pipeline permissions; roles bound to a pipeline grant them on that pipeline only
+		{Name: "pipelines.view", DisplayName: "View Deployment Pipelines", Category: "k8s", Resource: "pipelines", Action: "view", Scope: PermissionScopeGlobal},
+		{Name: "pipelines.run", DisplayName: "Run Deployment Pipelines", Category: "k8s", Resource: "pipelines", Action: "run", Scope: PermissionScopeGlobal},
+		{Name: "pipelines.manage", DisplayName: "Manage Deployment Pipelines", Category: "k8s", Resource: "pipelines", Action: "manage", Scope: PermissionScopeGlobal},
+
+		// Image permissions
+		{Name: "images.inspect", DisplayName: "Inspect Registry Images", Category: "k8s", Resource: "images", Action: "inspect", Scope: PermissionScopeGlobal},
+
+		// Compliance permissions
+		{Name: "compliance.view", DisplayName: "View Compliance Reports", Category: "compliance", Resource: "compliance", Action: "view", Scope: PermissionScopeGlobal},
+		{Name: "compliance.run", DisplayName: "Run Compliance Scans", Category: "compliance", Resource: "compliance", Action: "run", Scope: PermissionScopeGlobal},
+		{Name: "compliance.manage", DisplayName: "Manage Compliance Schedules", Category: "compliance", Resource: "compliance", Action: "manage", Scope: PermissionScopeGlobal},
+
+		// Report permissions
+		{Name: "reports.view", DisplayName: "View Reports", Category: "reports", Resource: "reports", Action: "view", Scope: PermissionScopeGlobal},
+		{Name: "reports.manage", DisplayName: "Generate Reports and Manage Schedules", Category: "reports", Resource: "reports", Action: "manage", Scope: PermissionScopeGlobal},
+		{Name: "reports.export", DisplayName: "Export Raw Data", Category: "reports", Resource: "reports", Action: "export", Scope: PermissionScopeGlobal},
+
+		// Alert permissions
+		{Name: "alerts.list", DisplayName: "View Alerts", Category: "observability", Resource: "alerts", Action: "list", Scope: PermissionScopeGlobal},
+		{Name: "alerts.silence", DisplayName: "Acknowledge and Silence Alerts", Category: "observability", Resource: "alerts", Action: "silence", Scope: PermissionScopeGlobal},
+		{Name: "alerts.resolve", DisplayName: "Resolve Alerts", Category: "observability", Resource: "alerts", Action: "resolve", Scope: PermissionScopeGlobal},
+
 		// Observability permissions
 		{Name: "otel.list", DisplayName: "List OTEL Collectors", Category: "observability", Resource: "otel", Action: "list", Scope: PermissionScopeGlobal},
 		{Name: "otel.manage", DisplayName: "Manage OTEL Collectors", Category: "observability", Resource: "otel", Action: "manage", Scope: PermissionScopeGlobal},
@@ -510,6 +546,15 @@ func SeedDefaultPermissions(db *gorm.DB) error {
 		{Name: "policies.list", DisplayName: "View Access Policies", Category: "system", Resource: "policies", Action: "list", Scope: PermissionScopeGlobal},
 		{Name: "policies.manage", DisplayName: "Manage Access Policies", Category: "system", Resource: "policies", Action: "manage", Scope: PermissionScopeGlobal},
 		{Name: "audit.view", DisplayName: "View Audit Logs", Category: "system", Resource: "audit", Action: "view", Scope: PermissionScopeGlobal},
+		{Name: "system.health", DisplayName: "View System Health", Category: "system", Resource: "system", Action: "health", Scope: PermissionScopeGlobal},
+		{Name: "system.diagnostics", DisplayName: "Download Diagnostics Bundles", Category: "system", Resource: "system", Action: "diagnostics", Scope: PermissionScopeGlobal},
+		{Name: "settings.view", DisplayName: "View Settings", Category: "system", Resource: "settings", Action: "view", Scope: PermissionScopeGlobal},
+		{Name: "settings.manage", DisplayName: "Manage Settings", Category: "system", Resource: "settings", Action: "manage", Scope: PermissionScopeGlobal},
+		{Name: "feature_flags.view", DisplayName: "View Feature Flags", Category: "system", Resource: "feature_flags", Action: "view", Scope: PermissionScopeGlobal},
+		{Name: "feature_flags.manage", DisplayName: "Manage Feature Flags", Category: "system", Resource: "feature_flags", Action: "manage", Scope: PermissionScopeGlobal},
+		{Name: "backups.view", DisplayName: "View Backups", Category: "system", Resource: "backups", Action: "view", Scope: PermissionScopeGlobal},
+		{Name: "backups.manage", DisplayName: "Manage Backups", Category: "system", Resource: "backups", Action: "manage", Scope: PermissionScopeGlobal},
+		{Name: "tags.manage", DisplayName: "Tag Any Resource", Category: "system", Resource: "tags", Action: "manage", Scope: PermissionScopeGlobal},
 	}
 
 	for _, perm := range permissions {
@@ -0,0 +1,175 @@
+// Package model provides data models for pushing host metrics to remote_write endpoints
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RemoteWriteTarget is a Prometheus-compatible remote_write endpoint that receives
+// the metrics agents report for a group of hosts
+type RemoteWriteTarget struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	CreatedBy uuid.UUID `gorm:"type:uuid;not null" json:"createdBy"`
+	Name      string    `gorm:"size:255;not null;uniqueIndex" json:"name"`
+	URL       string    `gorm:"size:2048;not null" json:"url"` // e.g. http://prometheus:9090/api/v1/write
+	Enabled   bool      `gorm:"default:true" json:"enabled"`
+
+	// Authentication
+	Username        string `gorm:"size:255" json:"username,omitempty"`
+	Password        string `gorm:"size:255" json:"-"`
+	BearerToken     string `gorm:"size:2048" json:"-"`
+	TenantID        string `gorm:"size:255" json:"tenantId,omitempty"` // Sent as X-Scope-OrgID
+	Headers         string `gorm:"type:text" json:"headers,omitempty"` // JSON object
+	InsecureSkipTLS bool   `gorm:"default:false" json:"insecureSkipTLS"`
+
+	// Host group and relabeling
+	HostLabels string `gorm:"type:text" json:"-"` // JSON object; hosts must carry all of these labels
+	HostTags   string `gorm:"type:text" json:"-"` // JSON array; hosts must carry one of these tags when set
+	Relabel    string `gorm:"type:text" json:"-"` // JSON array of RelabelConfig
+
+	// Batching
+	BatchSize     int `gorm:"default:500" json:"batchSize"`    // Series per request
+	FlushInterval int `gorm:"default:15" json:"flushInterval"` // seconds
+	MaxRetries    int `gorm:"default:5" json:"maxRetries"`
+}
+
+// TableName specifies the table name for RemoteWriteTarget
+func (RemoteWriteTarget) TableName() string {
+	return "remote_write_targets"
+}
+
+// Relabel action constants, with the semantics of Prometheus relabel_configs
+const (
+	RelabelReplace   = "replace"
+	RelabelKeep      = "keep"
+	RelabelDrop      = "drop"
+	RelabelLabelMap  = "labelmap"
+	RelabelLabelDrop = "labeldrop"
+	RelabelLabelKeep = "labelkeep"
+)
+
+// RelabelConfig is one relabeling step applied to every series before it is sent.
+// Host labels are available as __meta_host_label_<name> and tags as __meta_host_tags;
+// labels starting with __ other than __name__ are removed after relabeling.
+type RelabelConfig struct {
+	SourceLabels []string `json:"sourceLabels,omitempty"`
+	Separator    string   `json:"separator,omitempty"` // ";" when empty
+	Regex        string   `json:"regex,omitempty"`     // "(.*)" when empty
+	TargetLabel  string   `json:"targetLabel,omitempty"`
+	Replacement  string   `json:"replacement,omitempty"` // "$1" when empty
+	Action       string   `json:"action,omitempty"`      // replace when empty
+}
+
+// RemoteWriteStatus is how delivery to a target has gone since the gateway started
+type RemoteWriteStatus struct {
+	PendingSeries int        `json:"pendingSeries"`
+	SentSeries    int64      `json:"sentSeries"`
+	DroppedSeries int64      `json:"droppedSeries"` // Discarded when the queue was full
+	FailedBatches int64      `json:"failedBatches"` // Given up on after the retries
+	LastSentAt    *time.Time `json:"lastSentAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorAt   *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// RemoteWriteTargetResponse is a target with its decoded host group and relabeling
+type RemoteWriteTargetResponse struct {
+	RemoteWriteTarget
+	HostLabels map[string]string  `json:"hostLabels"`
+	HostTags   []string           `json:"hostTags"`
+	Relabel    []RelabelConfig    `json:"relabel"`
+	Status     *RemoteWriteStatus `json:"status,omitempty"`
+}
+
+// Response decodes the target's host group and relabeling
+func (t *RemoteWriteTarget) Response() RemoteWriteTargetResponse {
+	resp := RemoteWriteTargetResponse{
+		RemoteWriteTarget: *t,
+		HostLabels:        map[string]string{},
+		HostTags:          []string{},
+		Relabel:           []RelabelConfig{},
+	}
+	if t.HostLabels != "" {
+		json.Unmarshal([]byte(t.HostLabels), &resp.HostLabels)
+	}
+	if t.HostTags != "" {
+		json.Unmarshal([]byte(t.HostTags), &resp.HostTags)
+	}
+	if t.Relabel != "" {
+		json.Unmarshal([]byte(t.Relabel), &resp.Relabel)
+	}
+	return resp
+}
+
+// CreateRemoteWriteTargetRequest is a request to add a remote_write target
+type CreateRemoteWriteTargetRequest struct {
+	Name            string            `json:"name"`
+	URL             string            `json:"url"`
+	Enabled         *bool             `json:"enabled,omitempty"` // true when omitted
+	Username        string            `json:"username,omitempty"`
+	Password        string            `json:"password,omitempty"`
+	BearerToken     string            `json:"bearerToken,omitempty"`
+	TenantID        string            `json:"tenantId,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	InsecureSkipTLS bool              `json:"insecureSkipTLS,omitempty"`
+	HostLabels      map[string]string `json:"hostLabels,omitempty"`
+	HostTags        []string          `json:"hostTags,omitempty"`
+	Relabel         []RelabelConfig   `json:"relabel,omitempty"`
+	BatchSize       int               `json:"batchSize,omitempty"`
+	FlushInterval   int               `json:"flushInterval,omitempty"`
+	MaxRetries      *int              `json:"maxRetries,omitempty"`
+}
+
+// UpdateRemoteWriteTargetRequest changes the given fields of a remote_write target
+type UpdateRemoteWriteTargetRequest struct {
+	Name            *string            `json:"name,omitempty"`
+	URL             *string            `json:"url,omitempty"`
+	Enabled         *bool              `json:"enabled,omitempty"`
+	Username        *string            `json:"username,omitempty"`
+	Password        *string            `json:"password,omitempty"`
+	BearerToken     *string            `json:"bearerToken,omitempty"`
+	TenantID        *string            `json:"tenantId,omitempty"`
+	Headers         *map[string]string `json:"headers,omitempty"`
+	InsecureSkipTLS *bool              `json:"insecureSkipTLS,omitempty"`
+	HostLabels      *map[string]string `json:"hostLabels,omitempty"`
+	HostTags        *[]string          `json:"hostTags,omitempty"`
+	Relabel         *[]RelabelConfig   `json:"relabel,omitempty"`
+	BatchSize       *int               `json:"batchSize,omitempty"`
+	FlushInterval   *int               `json:"flushInterval,omitempty"`
+	MaxRetries      *int               `json:"maxRetries,omitempty"`
+}
+
+// HostMetricsReport is the utilization an agent samples with each report
+type HostMetricsReport struct {
+	CPUUsagePercent float64              `json:"cpuUsagePercent"`
+	Load1           float64              `json:"load1"`
+	Load5           float64              `json:"load5"`
+	Load15          float64              `json:"load15"`
+	MemoryUsed      uint64               `json:"memoryUsed"`      // bytes
+	MemoryAvailable uint64               `json:"memoryAvailable"` // bytes
+	SwapUsed        uint64               `json:"swapUsed"`        // bytes
+	UptimeSeconds   uint64               `json:"uptimeSeconds"`
+	Networks        []HostNetworkCounter `json:"networks,omitempty"`
+}
+
+// HostNetworkCounter is the traffic of one interface since boot
+type HostNetworkCounter struct {
+	Name      string `json:"name"`
+	BytesSent uint64 `json:"bytesSent"`
+	BytesRecv uint64 `json:"bytesRecv"`
+}
+
+// HostDiskUsage is a disk as agents report it
+type HostDiskUsage struct {
+	Device     string `json:"device"`
+	MountPoint string `json:"mountPoint"`
+	FileSystem string `json:"fileSystem"`
+	Total      uint64 `json:"total"` // bytes
+	Used       uint64 `json:"used"`  // bytes
+	Free       uint64 `json:"free"`  // bytes
+}
@@ -0,0 +1,234 @@
+// Package model provides data models for scheduled reports
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReportSection is a part of a report
+type ReportSection string
+
+const (
+	ReportSectionHostAvailability ReportSection = "host_availability"
+	ReportSectionAlertSummary     ReportSection = "alert_summary"
+	ReportSectionTopAnomalies     ReportSection = "top_anomalies"
+	ReportSectionClusterCapacity  ReportSection = "cluster_capacity"
+)
+
+// ReportFormat is the file format a report is delivered in
+type ReportFormat string
+
+const (
+	ReportFormatPDF ReportFormat = "pdf"
+	ReportFormatCSV ReportFormat = "csv"
+)
+
+// ReportStatus is the state of a generated report
+type ReportStatus string
+
+const (
+	ReportStatusPending   ReportStatus = "pending" // Queued for generation
+	ReportStatusCompleted ReportStatus = "completed"
+	ReportStatusFailed    ReportStatus = "failed"
+)
+
+// ReportTemplate is a named set of sections
+type ReportTemplate struct {
+	Name        string          `json:"name"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Sections    []ReportSection `json:"sections"`
+}
+
+// ReportTemplates lists the templates reports are generated from
+var ReportTemplates = []ReportTemplate{
+	{"operations", "Operations report", "Host availability, alerts by severity, top anomalies and cluster capacity",
+		[]ReportSection{ReportSectionHostAvailability, ReportSectionAlertSummary, ReportSectionTopAnomalies, ReportSectionClusterCapacity}},
+	{"availability", "Availability report", "Host availability and cluster capacity",
+		[]ReportSection{ReportSectionHostAvailability, ReportSectionClusterCapacity}},
+	{"incidents", "Incident report", "Alerts by severity and top anomalies",
+		[]ReportSection{ReportSectionAlertSummary, ReportSectionTopAnomalies}},
+}
+
+// LookupReportTemplate returns the template of a name
+func LookupReportTemplate(name string) (ReportTemplate, bool) {
+	for _, t := range ReportTemplates {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return ReportTemplate{}, false
+}
+
+// ReportSchedule generates a report on a cron schedule and delivers it to its
+// recipients. Each report covers the Window seconds before it was generated.
+type ReportSchedule struct {
+	ID         uuid.UUID    `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	Name       string       `json:"name" gorm:"type:varchar(255);not null;uniqueIndex"`
+	Template   string       `json:"template" gorm:"type:varchar(50);not null"`
+	Format     ReportFormat `json:"format" gorm:"type:varchar(10);not null"`
+	Schedule   string       `json:"schedule" gorm:"type:varchar(100);not null"`   // crontab(5) schedule, e.g. 0 8 * * 1
+	Window     int          `json:"window" gorm:"column:window_seconds;not null"` // seconds
+	Recipients string       `json:"-" gorm:"type:jsonb"`                          // JSON array of user IDs; the creator when empty
+	Enabled    bool         `json:"enabled" gorm:"default:true"`
+	CreatedBy  uuid.UUID    `json:"createdBy" gorm:"type:uuid;not null"`
+	LastRunAt  *time.Time   `json:"lastRunAt,omitempty"`
+	NextRunAt  *time.Time   `json:"nextRunAt,omitempty" gorm:"index"` // Empty when disabled
+	CreatedAt  time.Time    `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time    `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for ReportSchedule
+func (ReportSchedule) TableName() string {
+	return "report_schedules"
+}
+
+// ReportScheduleResponse is a schedule with its recipients decoded
+type ReportScheduleResponse struct {
+	ReportSchedule
+	Recipients []uuid.UUID `json:"recipients"`
+}
+
+// Response decodes the schedule's recipients
+func (s *ReportSchedule) Response() ReportScheduleResponse {
+	resp := ReportScheduleResponse{ReportSchedule: *s, Recipients: []uuid.UUID{}}
+	if s.Recipients != "" {
+		json.Unmarshal([]byte(s.Recipients), &resp.Recipients)
+	}
+	return resp
+}
+
+// Report is a generated report kept in the archive
+type Report struct {
+	ID          uuid.UUID    `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	ScheduleID  *uuid.UUID   `json:"scheduleId,omitempty" gorm:"type:uuid;index"`
+	TriggeredBy *uuid.UUID   `json:"triggeredBy,omitempty" gorm:"type:uuid"` // Empty for scheduled reports
+	Title       string       `json:"title" gorm:"type:varchar(255);not null"`
+	Template    string       `json:"template" gorm:"type:varchar(50);not null"`
+	Format      ReportFormat `json:"format" gorm:"type:varchar(10);not null"`
+	Recipients  string       `json:"-" gorm:"type:jsonb"` // JSON array of user IDs
+	PeriodStart time.Time    `json:"periodStart" gorm:"not null"`
+	PeriodEnd   time.Time    `json:"periodEnd" gorm:"not null"`
+	Status      ReportStatus `json:"status" gorm:"type:varchar(20);not null"`
+	Data        string       `json:"-" gorm:"type:jsonb"` // ReportData
+	Error       string       `json:"error,omitempty" gorm:"type:text"`
+	CompletedAt *time.Time   `json:"completedAt,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt" gorm:"autoCreateTime;index"`
+}
+
+// TableName specifies the table name for Report
+func (Report) TableName() string {
+	return "reports"
+}
+
+// ReportResponse is a report with its data decoded
+type ReportResponse struct {
+	Report
+	Data *ReportData `json:"data,omitempty"`
+}
+
+// Response decodes the report's data
+func (r *Report) Response() ReportResponse {
+	resp := ReportResponse{Report: *r}
+	if r.Data != "" {
+		resp.Data = &ReportData{}
+		json.Unmarshal([]byte(r.Data), resp.Data)
+	}
+	return resp
+}
+
+// ReportData is what a report found about its period. Sections the template
+// leaves out are empty.
+type ReportData struct {
+	Sections         []ReportSection          `json:"sections"`
+	HostAvailability []ReportHostAvailability `json:"hostAvailability,omitempty"`
+	AlertSummary     []ReportAlertCount       `json:"alertSummary,omitempty"`
+	TopAnomalies     []ReportAnomaly          `json:"topAnomalies,omitempty"`
+	ClusterCapacity  []ReportClusterCapacity  `json:"clusterCapacity,omitempty"`
+}
+
+// ReportHostAvailability is the share of the period a host was not offline
+type ReportHostAvailability struct {
+	HostID          uuid.UUID  `json:"hostId"`
+	Hostname        string     `json:"hostname"`
+	Status          HostStatus `json:"status"`
+	Outages         int        `json:"outages"`
+	DowntimeSeconds int64      `json:"downtimeSeconds"`
+	Availability    float64    `json:"availability"` // percent
+}
+
+// ReportAlertCount counts the alerts of a severity that fired in the period
+type ReportAlertCount struct {
+	Severity AlertSeverity `json:"severity"`
+	Fired    int64         `json:"fired"`
+	Resolved int64         `json:"resolved"` // Of those fired, resolved by the end of the period
+}
+
+// ReportAnomaly is one of the largest anomalies of the period
+type ReportAnomaly struct {
+	ID           uuid.UUID  `json:"id"`
+	Severity     string     `json:"severity"`
+	MetricName   string     `json:"metricName"`
+	HostID       *uuid.UUID `json:"hostId,omitempty"`
+	ClusterID    *uuid.UUID `json:"clusterId,omitempty"`
+	CurrentValue float64    `json:"currentValue"`
+	Deviation    float64    `json:"deviation"`
+	Description  string     `json:"description"`
+	DetectedAt   time.Time  `json:"detectedAt"`
+}
+
+// ReportClusterCapacity summarizes a cluster's metric snapshots of the period
+type ReportClusterCapacity struct {
+	ClusterID        uuid.UUID `json:"clusterId"`
+	Name             string    `json:"name"`
+	Samples          int64     `json:"samples"`
+	AvgCPUPercent    float64   `json:"avgCpuPercent"`
+	MaxCPUPercent    float64   `json:"maxCpuPercent"`
+	AvgMemoryPercent float64   `json:"avgMemoryPercent"`
+	MaxMemoryPercent float64   `json:"maxMemoryPercent"`
+	Nodes            int32     `json:"nodes"` // In the last snapshot
+	Pods             int32     `json:"pods"`
+}
+
+// CreateReportScheduleRequest is a request to generate a report on a schedule
+type CreateReportScheduleRequest struct {
+	Name       string       `json:"name"`
+	Template   string       `json:"template"`
+	Format     ReportFormat `json:"format,omitempty"` // pdf when omitted
+	Schedule   string       `json:"schedule"`
+	Window     int          `json:"window,omitempty"`     // seconds; a week when omitted
+	Recipients []uuid.UUID  `json:"recipients,omitempty"` // The creator when empty
+	Enabled    *bool        `json:"enabled,omitempty"`    // true when omitted
+}
+
+// UpdateReportScheduleRequest changes the given fields of a schedule
+type UpdateReportScheduleRequest struct {
+	Name       *string       `json:"name,omitempty"`
+	Template   *string       `json:"template,omitempty"`
+	Format     *ReportFormat `json:"format,omitempty"`
+	Schedule   *string       `json:"schedule,omitempty"`
+	Window     *int          `json:"window,omitempty"`
+	Recipients *[]uuid.UUID  `json:"recipients,omitempty"`
+	Enabled    *bool         `json:"enabled,omitempty"`
+}
+
+// GenerateReportRequest is a request to generate a report now
+type GenerateReportRequest struct {
+	Template   string       `json:"template"`
+	Format     ReportFormat `json:"format,omitempty"`     // pdf when omitted
+	Window     int          `json:"window,omitempty"`     // seconds; a week when omitted
+	Recipients []uuid.UUID  `json:"recipients,omitempty"` // The requester when empty
+}
+
+// ReportFilter selects archived reports
+type ReportFilter struct {
+	ScheduleID *uuid.UUID
+	Status     ReportStatus
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
@@ -0,0 +1,17 @@
+// Package model provides data models for the latency SLOs of gateway routes
+package model
+
+import "time"
+
+// RouteLatency is the latency of a gateway route over the tracking window,
+// against its SLO thresholds. Thresholds of 0 are not checked.
+type RouteLatency struct {
+	Route          string     `json:"route"` // Method and path pattern, such as "GET /api/v1/hosts/*"
+	Requests       int        `json:"requests"`
+	P95Ms          float64    `json:"p95Ms"`
+	P99Ms          float64    `json:"p99Ms"`
+	P95ThresholdMs float64    `json:"p95ThresholdMs"`
+	P99ThresholdMs float64    `json:"p99ThresholdMs"`
+	Breached       bool       `json:"breached"`
+	BreachedSince  *time.Time `json:"breachedSince,omitempty"`
+}
@@ -0,0 +1,134 @@
+// Package model provides data models for runbooks, the automated remediations
+// attached to alert rules
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RunbookAction is what a runbook does when it runs
+type RunbookAction string
+
+const (
+	RunbookActionBatchTask         RunbookAction = "batch_task"         // runs a copy of a batch task
+	RunbookActionRestartDeployment RunbookAction = "restart_deployment" // rolls a deployment's pods
+	RunbookActionScaleDeployment   RunbookAction = "scale_deployment"   // adds replicas to a deployment
+)
+
+// RunbookTrigger is how a runbook is started
+type RunbookTrigger string
+
+const (
+	RunbookTriggerAuto   RunbookTrigger = "auto"   // when an alert of the rule fires
+	RunbookTriggerManual RunbookTrigger = "manual" // with one click from a firing alert
+)
+
+// Runbook execution status constants
+const (
+	RunbookExecutionRunning   = "running"
+	RunbookExecutionSucceeded = "succeeded"
+	RunbookExecutionFailed    = "failed"
+	RunbookExecutionSkipped   = "skipped" // held back by a guardrail
+)
+
+// Runbook is a remediation attached to an alert rule. Guardrails bound how often
+// it runs, whatever starts it.
+type Runbook struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID      `json:"userId" gorm:"type:uuid;not null;index"` // owner of the rule; actions run with their permissions
+	RuleID      uuid.UUID      `json:"ruleId" gorm:"type:uuid;not null;index"`
+	Name        string         `json:"name" gorm:"type:varchar(255);not null"`
+	Description string         `json:"description" gorm:"type:text"`
+	Action      RunbookAction  `json:"action" gorm:"type:varchar(30);not null"`
+	Trigger     RunbookTrigger `json:"trigger" gorm:"type:varchar(20);not null"`
+	Enabled     bool           `json:"enabled" gorm:"not null;default:true"`
+
+	// batch_task: the task copied for each run, on its hosts or only on the
+	// alert's host
+	TaskTemplateID *uuid.UUID `json:"taskTemplateId,omitempty" gorm:"type:uuid"`
+	AlertHostOnly  bool       `json:"alertHostOnly" gorm:"not null;default:false"`
+
+	// restart_deployment and scale_deployment
+	ClusterID   *uuid.UUID `json:"clusterId,omitempty" gorm:"type:uuid"`
+	Namespace   string     `json:"namespace,omitempty" gorm:"type:varchar(253)"`
+	Deployment  string     `json:"deployment,omitempty" gorm:"type:varchar(253)"`
+	ScaleBy     int32      `json:"scaleBy,omitempty" gorm:"not null;default:0"`
+	MaxReplicas int32      `json:"maxReplicas,omitempty" gorm:"not null;default:0"` // 0 = no limit
+
+	// Guardrails
+	Cooldown   int `json:"cooldown" gorm:"not null;default:600"` // seconds between runs
+	MaxPerHour int `json:"maxPerHour" gorm:"not null;default:3"` // 0 = no limit
+
+	CreatedAt time.Time `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for Runbook
+func (Runbook) TableName() string {
+	return "runbooks"
+}
+
+// RunbookExecution is one run of a runbook, or one held back by its guardrails,
+// for the alert that triggered it
+type RunbookExecution struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RunbookID   uuid.UUID      `json:"runbookId" gorm:"type:uuid;not null;index"`
+	RuleID      uuid.UUID      `json:"ruleId" gorm:"type:uuid;not null"`
+	AlertID     uuid.UUID      `json:"alertId" gorm:"type:uuid;not null;index"`
+	UserID      uuid.UUID      `json:"userId" gorm:"type:uuid;not null;index"`
+	Trigger     RunbookTrigger `json:"trigger" gorm:"type:varchar(20);not null"`
+	TriggeredBy *uuid.UUID     `json:"triggeredBy,omitempty" gorm:"type:uuid"` // user who clicked, for manual runs
+	Status      string         `json:"status" gorm:"type:varchar(20);not null;index"`
+	Message     string         `json:"message" gorm:"type:text"`
+	BatchTaskID *uuid.UUID     `json:"batchTaskId,omitempty" gorm:"type:uuid"` // task created by a batch_task run
+	StartedAt   time.Time      `json:"startedAt" gorm:"not null"`
+	CompletedAt *time.Time     `json:"completedAt,omitempty"`
+}
+
+// TableName specifies the table name for RunbookExecution
+func (RunbookExecution) TableName() string {
+	return "runbook_executions"
+}
+
+// CreateRunbookRequest represents a request to attach a runbook to an alert rule
+type CreateRunbookRequest struct {
+	Name           string         `json:"name"`
+	Description    string         `json:"description"`
+	Action         RunbookAction  `json:"action"`
+	Trigger        RunbookTrigger `json:"trigger"`
+	Enabled        *bool          `json:"enabled"`
+	TaskTemplateID *uuid.UUID     `json:"taskTemplateId"`
+	AlertHostOnly  bool           `json:"alertHostOnly"`
+	ClusterID      *uuid.UUID     `json:"clusterId"`
+	Namespace      string         `json:"namespace"`
+	Deployment     string         `json:"deployment"`
+	ScaleBy        int32          `json:"scaleBy"`
+	MaxReplicas    int32          `json:"maxReplicas"`
+	Cooldown       *int           `json:"cooldown"`
+	MaxPerHour     *int           `json:"maxPerHour"`
+}
+
+// UpdateRunbookRequest represents a request to update a runbook. Omitted fields
+// keep their value; the action is fixed once created.
+type UpdateRunbookRequest struct {
+	Name           *string         `json:"name"`
+	Description    *string         `json:"description"`
+	Trigger        *RunbookTrigger `json:"trigger"`
+	Enabled        *bool           `json:"enabled"`
+	TaskTemplateID *uuid.UUID      `json:"taskTemplateId"`
+	AlertHostOnly  *bool           `json:"alertHostOnly"`
+	ClusterID      *uuid.UUID      `json:"clusterId"`
+	Namespace      *string         `json:"namespace"`
+	Deployment     *string         `json:"deployment"`
+	ScaleBy        *int32          `json:"scaleBy"`
+	MaxReplicas    *int32          `json:"maxReplicas"`
+	Cooldown       *int            `json:"cooldown"`
+	MaxPerHour     *int            `json:"maxPerHour"`
+}
+
+// ExecuteRunbookRequest represents a one-click run of a runbook for an alert
+type ExecuteRunbookRequest struct {
+	AlertID uuid.UUID `json:"alertId"`
+}
@@ -0,0 +1,63 @@
+// Package model provides data models for the global inventory search
+package model
+
+import (
+	"github.com/google/uuid"
+)
+
+// SearchResultType is the kind of resource a search result is
+type SearchResultType string
+
+const (
+	SearchResultHost        SearchResultType = "host"
+	SearchResultCluster     SearchResultType = "cluster"
+	SearchResultPod         SearchResultType = "pod"
+	SearchResultDeployment  SearchResultType = "deployment"
+	SearchResultDashboard   SearchResultType = "dashboard"
+	SearchResultAlertRule   SearchResultType = "alert_rule"
+	SearchResultHelmRelease SearchResultType = "helm_release"
+)
+
+// SearchResultTypes lists every result type in the order results are grouped
+var SearchResultTypes = []SearchResultType{
+	SearchResultHost,
+	SearchResultCluster,
+	SearchResultDeployment,
+	SearchResultPod,
+	SearchResultHelmRelease,
+	SearchResultDashboard,
+	SearchResultAlertRule,
+}
+
+// SearchRequest is a global search. Query is matched against names, or against
+// labels when it has the form key=value; a value ending in * matches by prefix.
+type SearchRequest struct {
+	Query string
+	Types []SearchResultType // every type when empty
+	Limit int                // results per type
+}
+
+// SearchResult is a resource matching a search, with where to open it
+type SearchResult struct {
+	Type        SearchResultType `json:"type"`
+	ID          string           `json:"id"` // UUID, or namespace/name for pods and deployments
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"` // e.g. the address of a host or the chart of a release
+	ClusterID   *uuid.UUID       `json:"clusterId,omitempty"`
+	ClusterName string           `json:"clusterName,omitempty"`
+	Namespace   string           `json:"namespace,omitempty"`
+	Status      string           `json:"status,omitempty"`
+	Label       string           `json:"label,omitempty"` // The key=value that matched, for label searches
+	Link        string           `json:"link"`            // Route of the resource in the UI, or a URL when External
+	External    bool             `json:"external,omitempty"`
+	Score       int              `json:"score"` // Higher for exact and prefix name matches
+}
+
+// SearchResponse is the results of a global search, grouped by type and best
+// first within a type
+type SearchResponse struct {
+	Query    string         `json:"query"`
+	Results  []SearchResult `json:"results"`
+	Indexing bool           `json:"indexing"` // Some clusters have not been indexed yet, so pods and deployments may be missing
+	Took     int64          `json:"took"`     // milliseconds
+}
@@ -0,0 +1,276 @@
+// Package model provides data models for runtime settings
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SettingType is the type a setting value is parsed as
+type SettingType string
+
+const (
+	SettingTypeString   SettingType = "string"
+	SettingTypeInt      SettingType = "int"
+	SettingTypeFloat    SettingType = "float"
+	SettingTypeBool     SettingType = "bool"
+	SettingTypeDuration SettingType = "duration"
+	SettingTypeJSON     SettingType = "json"
+)
+
+// Runtime setting keys
+const (
+	SettingLLMBaseURL            = "llm.base_url"
+	SettingLLMAPIKey             = "llm.api_key"
+	SettingLLMModel              = "llm.model"
+	SettingLLMPricing            = "llm.pricing"
+	SettingMetricsRetention      = "metrics.retention"
+	SettingQueryHistoryRetention = "prometheus.query_history_retention"
+	SettingQueryHistoryPerUser   = "prometheus.query_history_per_user"
+	SettingComplianceRetention   = "compliance.report_retention"
+	SettingOperationRetention    = "operations.retention"
+	SettingJobRetention          = "jobs.retention"
+	SettingJobWorkers            = "jobs.workers"
+	SettingReportRetention       = "reports.retention"
+	SettingSyntheticRetention    = "synthetics.retention"
+	SettingDiagnosticRetention   = "diagnostics.retention"
+	SettingRateLimitPerMinute    = "rate_limit.requests_per_minute"
+	SettingRateLimitBurst        = "rate_limit.burst"
+
+	SettingLimitJSONBodyBytes   = "limits.json_body_bytes"
+	SettingLimitUploadBodyBytes = "limits.upload_body_bytes"
+
+	SettingSecurityCORSOrigins = "security.cors_origins"
+	SettingSecurityCSP         = "security.content_security_policy"
+	SettingSecurityHSTSMaxAge  = "security.hsts_max_age"
+	SettingSecurityCSRFEnabled = "security.csrf_enabled"
+
+	SettingOIDCEnabled       = "oidc.enabled"
+	SettingOIDCIssuerURL     = "oidc.issuer_url"
+	SettingOIDCClientID      = "oidc.client_id"
+	SettingOIDCClientSecret  = "oidc.client_secret"
+	SettingOIDCRedirectURL   = "oidc.redirect_url"
+	SettingOIDCFrontendURL   = "oidc.frontend_url"
+	SettingOIDCScopes        = "oidc.scopes"
+	SettingOIDCUsernameClaim = "oidc.username_claim"
+	SettingOIDCGroupsClaim   = "oidc.groups_claim"
+
+	SettingLDAPEnabled        = "ldap.enabled"
+	SettingLDAPURL            = "ldap.url"
+	SettingLDAPBindDN         = "ldap.bind_dn"
+	SettingLDAPBindPassword   = "ldap.bind_password"
+	SettingLDAPBaseDN         = "ldap.base_dn"
+	SettingLDAPUserFilter     = "ldap.user_filter"
+	SettingLDAPGroupAttribute = "ldap.group_attribute"
+
+	SettingSSOGroupRoleMapping = "sso.group_role_mapping"
+	SettingSSODefaultRole      = "sso.default_role"
+
+	SettingDirectorySyncEnabled     = "directory_sync.enabled"
+	SettingDirectorySyncInterval    = "directory_sync.interval"
+	SettingDirectorySyncLDAPFilter  = "directory_sync.ldap_filter"
+	SettingDirectorySyncDeprovision = "directory_sync.deprovision"
+
+	SettingSCIMEnabled = "scim.enabled"
+	SettingSCIMToken   = "scim.token"
+
+	SettingAuthInvitationTTL    = "auth.invitation_ttl"
+	SettingAuthPasswordResetTTL = "auth.password_reset_ttl"
+	SettingAuthLockoutThreshold = "auth.lockout_threshold"
+	SettingAuthLockoutDuration  = "auth.lockout_duration"
+	SettingAuthFrontendURL      = "auth.frontend_url"
+	SettingMFAIssuer            = "mfa.issuer"
+
+	SettingSMTPHost     = "smtp.host"
+	SettingSMTPPort     = "smtp.port"
+	SettingSMTPUsername = "smtp.username"
+	SettingSMTPPassword = "smtp.password"
+	SettingSMTPFrom     = "smtp.from"
+
+	SettingEmailReplyAddress      = "email_replies.address"
+	SettingEmailReplySigningKey   = "email_replies.signing_key"
+	SettingEmailReplyInboundToken = "email_replies.inbound_token"
+	SettingEmailReplyTokenTTL     = "email_replies.token_ttl"
+
+	SettingAuditCheckpointInterval = "audit.checkpoint_interval"
+	SettingAuditExportTarget       = "audit.export_target"
+	SettingAuditExportRetention    = "audit.export_retention_days"
+
+	SettingDataExportMaxBytes  = "data_exports.max_bytes"
+	SettingDataExportRetention = "data_exports.retention"
+	SettingDataExportLinkTTL   = "data_exports.link_ttl"
+
+	SettingDashboardShareLinkTTL       = "dashboards.share_link_ttl"
+	SettingDashboardShareLinkMaxTTL    = "dashboards.share_link_max_ttl"
+	SettingDashboardShareLinkPerMinute = "dashboards.share_link_requests_per_minute"
+
+	SettingQuotaUserClusters     = "quota.user_clusters"
+	SettingQuotaUserHosts        = "quota.user_hosts"
+	SettingQuotaUserDataSources  = "quota.user_data_sources"
+	SettingQuotaUserDashboards   = "quota.user_dashboards"
+	SettingQuotaUserLLMTokens    = "quota.user_llm_tokens"
+	SettingQuotaUserPortForwards = "quota.user_port_forwards"
+	SettingQuotaUserStagedBytes  = "quota.user_staged_bytes"
+
+	SettingClusterCredentialWarning = "clusters.credential_expiry_warning"
+	SettingClusterPortForwardTTL    = "clusters.port_forward_ttl"
+
+	SettingCertificateWarning  = "certificates.expiry_warning"
+	SettingCertificateCritical = "certificates.expiry_critical"
+)
+
+// Setting is a stored override of a runtime setting. Settings without a row use
+// their definition's default.
+type Setting struct {
+	Key       string     `gorm:"size:128;primary_key" json:"key"`
+	Value     string     `gorm:"type:text;not null" json:"value"`
+	UpdatedBy *uuid.UUID `gorm:"type:uuid" json:"updatedBy,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// TableName specifies the table name for Setting
+func (Setting) TableName() string {
+	return "settings"
+}
+
+// SettingDefinition describes a runtime-tunable setting
+type SettingDefinition struct {
+	Key         string      `json:"key"`
+	Type        SettingType `json:"type"`
+	Category    string      `json:"category"`
+	Description string      `json:"description"`
+	Default     string      `json:"default"`
+	Secret      bool        `json:"secret"` // Values are never returned by the API
+	Min         *float64    `json:"min,omitempty"`
+}
+
+func settingMin(v float64) *float64 {
+	return &v
+}
+
+// SettingDefinitions is the catalog of runtime settings. Defaults of settings that
+// also exist in the gateway config are replaced with the configured values at startup.
+var SettingDefinitions = []SettingDefinition{
+	{Key: SettingLLMBaseURL, Type: SettingTypeString, Category: "llm", Description: "Base URL of the OpenAI-compatible chat completion API"},
+	{Key: SettingLLMAPIKey, Type: SettingTypeString, Category: "llm", Description: "API key sent to the LLM provider", Secret: true},
+	{Key: SettingLLMModel, Type: SettingTypeString, Category: "llm", Description: "Model used when a conversation does not name one", Default: "gpt-4o-mini"},
+	{Key: SettingLLMPricing, Type: SettingTypeJSON, Category: "llm", Description: "JSON object mapping model names or name prefixes to {\"input\", \"output\"} prices in USD per million tokens", Default: "{}"},
+	{Key: SettingMetricsRetention, Type: SettingTypeDuration, Category: "retention", Description: "How long cluster metric snapshots and host metric history are kept; 0 keeps them forever", Default: "168h", Min: settingMin(0)},
+	{Key: SettingQueryHistoryRetention, Type: SettingTypeDuration, Category: "retention", Description: "How long Prometheus query history is kept; 0 keeps it forever", Default: "720h", Min: settingMin(0)},
+	{Key: SettingQueryHistoryPerUser, Type: SettingTypeInt, Category: "retention", Description: "Most recent Prometheus queries kept in each user's history; 0 is unlimited", Default: "1000", Min: settingMin(0)},
+	{Key: SettingComplianceRetention, Type: SettingTypeDuration, Category: "retention", Description: "How long compliance reports are kept; 0 keeps them forever", Default: "2160h", Min: settingMin(0)},
+	{Key: SettingOperationRetention, Type: SettingTypeDuration, Category: "retention", Description: "How long finished long-running operations are kept; 0 keeps them forever", Default: "168h", Min: settingMin(0)},
+	{Key: SettingJobRetention, Type: SettingTypeDuration, Category: "retention", Description: "How long succeeded background jobs are kept; 0 keeps them forever. Dead jobs are kept until requeued", Default: "72h", Min: settingMin(0)},
+	{Key: SettingJobWorkers, Type: SettingTypeInt, Category: "jobs", Description: "Background jobs each gateway instance runs at once; read at startup", Default: "4", Min: settingMin(1)},
+	{Key: SettingReportRetention, Type: SettingTypeDuration, Category: "retention", Description: "How long generated reports are kept in the archive; 0 keeps them forever", Default: "8760h", Min: settingMin(0)},
+	{Key: SettingSyntheticRetention, Type: SettingTypeDuration, Category: "retention", Description: "How long synthetic check results are kept; 0 keeps them forever", Default: "720h", Min: settingMin(0)},
+	{Key: SettingDiagnosticRetention, Type: SettingTypeDuration, Category: "retention", Description: "How long network diagnostic results are kept; 0 keeps them forever", Default: "2160h", Min: settingMin(0)},
+	{Key: SettingRateLimitPerMinute, Type: SettingTypeInt, Category: "rate_limit", Description: "Requests per minute allowed per client IP", Default: "100", Min: settingMin(1)},
+	{Key: SettingRateLimitBurst, Type: SettingTypeInt, Category: "rate_limit", Description: "Requests a client IP may send at once above its rate", Default: "10", Min: settingMin(1)},
+	{Key: SettingLimitJSONBodyBytes, Type: SettingTypeInt, Category: "limits", Description: "Largest request body in bytes accepted outside of file uploads", Default: "1048576", Min: settingMin(1024)},
+	{Key: SettingLimitUploadBodyBytes, Type: SettingTypeInt, Category: "limits", Description: "Largest file upload request in bytes", Default: "1073741824", Min: settingMin(1024)},
+
+	{Key: SettingSecurityCORSOrigins, Type: SettingTypeString, Category: "security", Description: "Comma separated origins allowed to call the API from browsers and open websockets", Default: "http://localhost:3000,http://localhost:5173"},
+	{Key: SettingSecurityCSP, Type: SettingTypeString, Category: "security", Description: "Content-Security-Policy header sent with every response; empty sends none", Default: "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; font-src 'self' data:; connect-src 'self' ws: wss:; frame-ancestors 'none'; base-uri 'self'; form-action 'self'"},
+	{Key: SettingSecurityHSTSMaxAge, Type: SettingTypeDuration, Category: "security", Description: "Strict-Transport-Security max age sent on HTTPS requests; 0 sends none", Default: "8760h", Min: settingMin(0)},
+	{Key: SettingSecurityCSRFEnabled, Type: SettingTypeBool, Category: "security", Description: "Require the CSRF token header on state-changing requests that carry cookies", Default: "true"},
+
+	{Key: SettingOIDCEnabled, Type: SettingTypeBool, Category: "oidc", Description: "Offer login through the OpenID Connect identity provider", Default: "false"},
+	{Key: SettingOIDCIssuerURL, Type: SettingTypeString, Category: "oidc", Description: "Issuer URL of the identity provider"},
+	{Key: SettingOIDCClientID, Type: SettingTypeString, Category: "oidc", Description: "Client ID registered with the identity provider"},
+	{Key: SettingOIDCClientSecret, Type: SettingTypeString, Category: "oidc", Description: "Client secret registered with the identity provider", Secret: true},
+	{Key: SettingOIDCRedirectURL, Type: SettingTypeString, Category: "oidc", Description: "Public URL of /api/v1/auth/oidc/callback, registered as the redirect URI"},
+	{Key: SettingOIDCFrontendURL, Type: SettingTypeString, Category: "oidc", Description: "Frontend page the browser returns to after login; tokens and errors are passed in the URL fragment"},
+	{Key: SettingOIDCScopes, Type: SettingTypeString, Category: "oidc", Description: "Space separated scopes to request", Default: "openid profile email groups"},
+	{Key: SettingOIDCUsernameClaim, Type: SettingTypeString, Category: "oidc", Description: "ID token claim used as the username", Default: "preferred_username"},
+	{Key: SettingOIDCGroupsClaim, Type: SettingTypeString, Category: "oidc", Description: "ID token claim listing the user's groups", Default: "groups"},
+
+	{Key: SettingLDAPEnabled, Type: SettingTypeBool, Category: "ldap", Description: "Offer login with LDAP bind authentication", Default: "false"},
+	{Key: SettingLDAPURL, Type: SettingTypeString, Category: "ldap", Description: "LDAP server URL, such as ldaps://ldap.example.com:636"},
+	{Key: SettingLDAPBindDN, Type: SettingTypeString, Category: "ldap", Description: "DN of the service account used to search for users"},
+	{Key: SettingLDAPBindPassword, Type: SettingTypeString, Category: "ldap", Description: "Password of the service account", Secret: true},
+	{Key: SettingLDAPBaseDN, Type: SettingTypeString, Category: "ldap", Description: "Base DN users are searched under"},
+	{Key: SettingLDAPUserFilter, Type: SettingTypeString, Category: "ldap", Description: "Search filter for users; %s is replaced with the username", Default: "(uid=%s)"},
+	{Key: SettingLDAPGroupAttribute, Type: SettingTypeString, Category: "ldap", Description: "User attribute listing the user's groups", Default: "memberOf"},
+
+	{Key: SettingSSOGroupRoleMapping, Type: SettingTypeJSON, Category: "sso", Description: "JSON object mapping IdP and LDAP group names to lists of role names", Default: "{}"},
+	{Key: SettingSSODefaultRole, Type: SettingTypeString, Category: "sso", Description: "Role given to every SSO user; empty for none", Default: "viewer"},
+
+	{Key: SettingDirectorySyncEnabled, Type: SettingTypeBool, Category: "directory_sync", Description: "Sync LDAP users and their group roles on a schedule", Default: "false"},
+	{Key: SettingDirectorySyncInterval, Type: SettingTypeDuration, Category: "directory_sync", Description: "How often the scheduled LDAP sync runs", Default: "1h", Min: settingMin(60)},
+	{Key: SettingDirectorySyncLDAPFilter, Type: SettingTypeString, Category: "directory_sync", Description: "Search filter selecting the LDAP users to sync", Default: "(objectClass=person)"},
+	{Key: SettingDirectorySyncDeprovision, Type: SettingTypeBool, Category: "directory_sync", Description: "Deactivate LDAP users no longer found in the directory", Default: "true"},
+
+	{Key: SettingSCIMEnabled, Type: SettingTypeBool, Category: "scim", Description: "Accept user and group provisioning through the SCIM 2.0 API at /scim/v2", Default: "false"},
+	{Key: SettingSCIMToken, Type: SettingTypeString, Category: "scim", Description: "Bearer token SCIM clients authenticate with", Secret: true},
+
+	{Key: SettingAuthInvitationTTL, Type: SettingTypeDuration, Category: "auth", Description: "How long an emailed invitation can be accepted", Default: "72h", Min: settingMin(60)},
+	{Key: SettingAuthPasswordResetTTL, Type: SettingTypeDuration, Category: "auth", Description: "How long a password reset link stays valid", Default: "1h", Min: settingMin(60)},
+	{Key: SettingAuthLockoutThreshold, Type: SettingTypeInt, Category: "auth", Description: "Failed password logins in a row that lock an account; 0 disables lockout", Default: "5", Min: settingMin(0)},
+	{Key: SettingAuthLockoutDuration, Type: SettingTypeDuration, Category: "auth", Description: "How long a locked account stays locked", Default: "15m", Min: settingMin(60)},
+	{Key: SettingAuthFrontendURL, Type: SettingTypeString, Category: "auth", Description: "Public frontend URL used to build invitation, password reset and dashboard share links"},
+	{Key: SettingMFAIssuer, Type: SettingTypeString, Category: "auth", Description: "Issuer name shown in authenticator apps", Default: "MyOps"},
+
+	{Key: SettingSMTPHost, Type: SettingTypeString, Category: "smtp", Description: "SMTP server that sends invitation and password reset emails; empty disables email"},
+	{Key: SettingSMTPPort, Type: SettingTypeInt, Category: "smtp", Description: "SMTP server port", Default: "587", Min: settingMin(1)},
+	{Key: SettingSMTPUsername, Type: SettingTypeString, Category: "smtp", Description: "SMTP username; empty sends without authentication"},
+	{Key: SettingSMTPPassword, Type: SettingTypeString, Category: "smtp", Description: "SMTP password", Secret: true},
+	{Key: SettingSMTPFrom, Type: SettingTypeString, Category: "smtp", Description: "From address of outgoing emails", Default: "myops@localhost"},
+
+	{Key: SettingEmailReplyAddress, Type: SettingTypeString, Category: "email_replies", Description: "Reply-To address of alert emails, whose mail is posted to /api/v1/email/inbound; empty disables replying to alerts"},
+	{Key: SettingEmailReplySigningKey, Type: SettingTypeString, Category: "email_replies", Description: "Key the reference in alert emails is signed with; changing it invalidates the references of sent emails", Secret: true},
+	{Key: SettingEmailReplyInboundToken, Type: SettingTypeString, Category: "email_replies", Description: "Bearer token, or basic auth password, the inbound email webhook authenticates with", Secret: true},
+	{Key: SettingEmailReplyTokenTTL, Type: SettingTypeDuration, Category: "email_replies", Description: "How long replies to an alert email can act on the alert", Default: "168h", Min: settingMin(60)},
+
+	{Key: SettingAuditCheckpointInterval, Type: SettingTypeDuration, Category: "audit", Description: "How often the audit log chain is checkpointed, and the records since the last checkpoint exported", Default: "1h", Min: settingMin(60)},
+	{Key: SettingAuditExportTarget, Type: SettingTypeString, Category: "audit", Description: "Name of the backup target audit records are exported to at each checkpoint, never overwriting an export; empty disables export"},
+	{Key: SettingAuditExportRetention, Type: SettingTypeInt, Category: "audit", Description: "Days S3 Object Lock keeps audit exports in compliance mode, when the bucket has Object Lock enabled; 0 does not lock them", Default: "0", Min: settingMin(0)},
+
+	{Key: SettingDataExportMaxBytes, Type: SettingTypeInt, Category: "data_exports", Description: "Largest file in bytes a data export may produce; larger exports fail and should be narrowed", Default: "104857600", Min: settingMin(1024)},
+	{Key: SettingDataExportRetention, Type: SettingTypeDuration, Category: "data_exports", Description: "How long completed data exports can be downloaded before they are deleted", Default: "24h", Min: settingMin(60)},
+	{Key: SettingDataExportLinkTTL, Type: SettingTypeDuration, Category: "data_exports", Description: "How long a signed data export download link lasts, at most until the export expires", Default: "1h", Min: settingMin(60)},
+
+	{Key: SettingDashboardShareLinkTTL, Type: SettingTypeDuration, Category: "dashboards", Description: "How long a public dashboard link lasts when its creator does not say", Default: "168h", Min: settingMin(60)},
+	{Key: SettingDashboardShareLinkMaxTTL, Type: SettingTypeDuration, Category: "dashboards", Description: "Longest lifetime a public dashboard link may be given", Default: "720h", Min: settingMin(60)},
+	{Key: SettingDashboardShareLinkPerMinute, Type: SettingTypeInt, Category: "dashboards", Description: "Views per minute allowed on each public dashboard link", Default: "30", Min: settingMin(1)},
+
+	{Key: SettingQuotaUserClusters, Type: SettingTypeInt, Category: "quota", Description: "Clusters each user may add unless a user quota says otherwise; 0 is unlimited", Default: "0", Min: settingMin(0)},
+	{Key: SettingQuotaUserHosts, Type: SettingTypeInt, Category: "quota", Description: "Hosts each user may register unless a user quota says otherwise; 0 is unlimited", Default: "0", Min: settingMin(0)},
+	{Key: SettingQuotaUserDataSources, Type: SettingTypeInt, Category: "quota", Description: "Prometheus, log and trace data sources each user may add; 0 is unlimited", Default: "0", Min: settingMin(0)},
+	{Key: SettingQuotaUserDashboards, Type: SettingTypeInt, Category: "quota", Description: "Dashboards each user may create; 0 is unlimited", Default: "0", Min: settingMin(0)},
+	{Key: SettingQuotaUserLLMTokens, Type: SettingTypeInt, Category: "quota", Description: "LLM tokens each user may use per calendar month; 0 is unlimited", Default: "0", Min: settingMin(0)},
+	{Key: SettingQuotaUserPortForwards, Type: SettingTypeInt, Category: "quota", Description: "Port-forward sessions each user may have open at once; 0 is unlimited", Default: "5", Min: settingMin(0)},
+	{Key: SettingQuotaUserStagedBytes, Type: SettingTypeInt, Category: "quota", Description: "Bytes of staged distribution files each user may keep; 0 is unlimited", Default: "0", Min: settingMin(0)},
+
+	{Key: SettingClusterCredentialWarning, Type: SettingTypeDuration, Category: "clusters", Description: "How long before a cluster's kubeconfig credentials expire its owner is first warned; 0 only warns once they expired", Default: "720h", Min: settingMin(0)},
+	{Key: SettingClusterPortForwardTTL, Type: SettingTypeDuration, Category: "clusters", Description: "Longest a port-forward session stays open before it is closed", Default: "1h", Min: settingMin(60)},
+
+	{Key: SettingCertificateWarning, Type: SettingTypeDuration, Category: "certificates", Description: "How long before a certificate expires its owner is first warned, unless the certificate sets its own threshold", Default: "720h", Min: settingMin(0)},
+	{Key: SettingCertificateCritical, Type: SettingTypeDuration, Category: "certificates", Description: "How long before a certificate expires it becomes critical and its owner is warned again, unless the certificate sets its own threshold", Default: "168h", Min: settingMin(0)},
+}
+
+// LookupSetting returns the definition of a setting key
+func LookupSetting(key string) (SettingDefinition, bool) {
+	for _, def := range SettingDefinitions {
+		if def.Key == key {
+			return def, true
+		}
+	}
+	return SettingDefinition{}, false
+}
+
+// SettingResponse is a setting's definition and effective value
+type SettingResponse struct {
+	SettingDefinition
+	Value      string     `json:"value"`
+	Overridden bool       `json:"overridden"` // Value is stored rather than the default
+	UpdatedBy  *uuid.UUID `json:"updatedBy,omitempty"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+}
+
+// UpdateSettingRequest represents a request to override a setting
+type UpdateSettingRequest struct {
+	Value string `json:"value"`
+}
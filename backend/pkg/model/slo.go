@@ -0,0 +1,142 @@
+// Package model provides data models for service level objectives
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SLOWindowPlaceholder is replaced in SLI queries with the window they cover,
+// e.g. sum(rate(http_requests_total{code!~"5.."}[$window]))
+const SLOWindowPlaceholder = "$window"
+
+// SLOStatus is the state of an SLO's error budget
+type SLOStatus string
+
+const (
+	SLOStatusMet      SLOStatus = "met"
+	SLOStatusAtRisk   SLOStatus = "at_risk"  // Less than a quarter of the budget is left
+	SLOStatusBreached SLOStatus = "breached" // The budget is spent
+	SLOStatusUnknown  SLOStatus = "unknown"  // Not evaluated yet, or the queries failed or returned no data
+)
+
+// SLO is a service level objective. Its SLI is the ratio of the GoodQuery and
+// TotalQuery results, e.g. 99.9% of requests succeeding over 30 days.
+type SLO struct {
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID       uuid.UUID `json:"userId" gorm:"type:uuid;not null;index"`
+	Name         string    `json:"name" gorm:"type:varchar(255);not null"`
+	Description  string    `json:"description" gorm:"type:text"`
+	DataSourceID uuid.UUID `json:"dataSourceId" gorm:"type:uuid;not null;index"`
+	GoodQuery    string    `json:"goodQuery" gorm:"type:text;not null"`  // Count of good events over $window
+	TotalQuery   string    `json:"totalQuery" gorm:"type:text;not null"` // Count of all events over $window
+	Objective    float64   `json:"objective" gorm:"not null"`            // percent, e.g. 99.9
+	Window       int       `json:"window" gorm:"column:window_seconds;not null"`
+	// JSON array of SLOBurnRateAlert
+	BurnRateAlerts string `json:"-" gorm:"type:jsonb"`
+	Enabled        bool   `json:"enabled" gorm:"default:true"`
+	// Last evaluation
+	Status               SLOStatus  `json:"status" gorm:"type:varchar(20);not null;default:unknown"`
+	SLI                  *float64   `json:"sli,omitempty" gorm:"column:sli"` // percent over the window
+	ErrorBudgetRemaining *float64   `json:"errorBudgetRemaining,omitempty"`  // percent; negative when overspent
+	LastEvaluatedAt      *time.Time `json:"lastEvaluatedAt,omitempty" gorm:"index"`
+	LastError            string     `json:"lastError,omitempty" gorm:"type:text"`
+	CreatedAt            time.Time  `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt            time.Time  `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for SLO
+func (SLO) TableName() string {
+	return "slos"
+}
+
+// SLOBurnRateAlert fires when the error budget burns Factor times faster than
+// the rate that spends it exactly over the SLO window, measured over both the
+// long and the short window. The short window resolves the alert soon after
+// the burn stops.
+type SLOBurnRateAlert struct {
+	RuleID        uuid.UUID     `json:"ruleId"` // The alert rule fired through the alert pipeline
+	Severity      AlertSeverity `json:"severity"`
+	Factor        float64       `json:"factor"`
+	LongWindow    int           `json:"longWindow"`  // seconds
+	ShortWindow   int           `json:"shortWindow"` // seconds
+	LongBurnRate  *float64      `json:"longBurnRate,omitempty"`
+	ShortBurnRate *float64      `json:"shortBurnRate,omitempty"`
+}
+
+// DefaultSLOBurnRateAlerts are the burn-rate alerts of an SLO that names none:
+// pages for spending 2% of a 30 day budget in an hour or 5% in six hours, and
+// tickets for 10% in a day or 10% in three days
+var DefaultSLOBurnRateAlerts = []SLOBurnRateAlert{
+	{Severity: AlertSeverityCritical, Factor: 14.4, LongWindow: 3600, ShortWindow: 300},
+	{Severity: AlertSeverityCritical, Factor: 6, LongWindow: 6 * 3600, ShortWindow: 1800},
+	{Severity: AlertSeverityWarning, Factor: 3, LongWindow: 24 * 3600, ShortWindow: 2 * 3600},
+	{Severity: AlertSeverityWarning, Factor: 1, LongWindow: 3 * 24 * 3600, ShortWindow: 6 * 3600},
+}
+
+// SLOResponse is an SLO with its burn-rate alerts decoded
+type SLOResponse struct {
+	SLO
+	BurnRateAlerts []SLOBurnRateAlert `json:"burnRateAlerts"`
+}
+
+// Response decodes the SLO's burn-rate alerts
+func (s *SLO) Response() SLOResponse {
+	resp := SLOResponse{SLO: *s, BurnRateAlerts: []SLOBurnRateAlert{}}
+	if s.BurnRateAlerts != "" {
+		json.Unmarshal([]byte(s.BurnRateAlerts), &resp.BurnRateAlerts)
+	}
+	return resp
+}
+
+// SLOBurnRateAlertRequest defines a burn-rate alert of an SLO
+type SLOBurnRateAlertRequest struct {
+	Severity    AlertSeverity `json:"severity"`
+	Factor      float64       `json:"factor"`
+	LongWindow  int           `json:"longWindow"`  // seconds
+	ShortWindow int           `json:"shortWindow"` // seconds
+}
+
+// CreateSLORequest is a request to define an SLO
+type CreateSLORequest struct {
+	Name           string                     `json:"name"`
+	Description    string                     `json:"description,omitempty"`
+	DataSourceID   uuid.UUID                  `json:"dataSourceId"`
+	GoodQuery      string                     `json:"goodQuery"`
+	TotalQuery     string                     `json:"totalQuery"`
+	Objective      float64                    `json:"objective"`
+	Window         int                        `json:"window,omitempty"`         // seconds; 30 days when omitted
+	BurnRateAlerts *[]SLOBurnRateAlertRequest `json:"burnRateAlerts,omitempty"` // DefaultSLOBurnRateAlerts when omitted
+	Enabled        *bool                      `json:"enabled,omitempty"`        // true when omitted
+}
+
+// UpdateSLORequest changes the given fields of an SLO
+type UpdateSLORequest struct {
+	Name           *string                    `json:"name,omitempty"`
+	Description    *string                    `json:"description,omitempty"`
+	DataSourceID   *uuid.UUID                 `json:"dataSourceId,omitempty"`
+	GoodQuery      *string                    `json:"goodQuery,omitempty"`
+	TotalQuery     *string                    `json:"totalQuery,omitempty"`
+	Objective      *float64                   `json:"objective,omitempty"`
+	Window         *int                       `json:"window,omitempty"`
+	BurnRateAlerts *[]SLOBurnRateAlertRequest `json:"burnRateAlerts,omitempty"`
+	Enabled        *bool                      `json:"enabled,omitempty"`
+}
+
+// SLOHistoryPoint is the SLI over the SLO window ending at a time
+type SLOHistoryPoint struct {
+	Timestamp            time.Time `json:"timestamp"`
+	SLI                  float64   `json:"sli"`                  // percent
+	ErrorBudgetRemaining float64   `json:"errorBudgetRemaining"` // percent
+}
+
+// SLOHistory is the error budget burn-down of an SLO
+type SLOHistory struct {
+	SLOID  uuid.UUID         `json:"sloId"`
+	Start  time.Time         `json:"start"`
+	End    time.Time         `json:"end"`
+	Step   int               `json:"step"` // seconds
+	Points []SLOHistoryPoint `json:"points"`
+}
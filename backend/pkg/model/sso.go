@@ -0,0 +1,31 @@
+// Package model provides data models for single sign-on
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Identity providers a user can be linked to
+const (
+	IdentityProviderOIDC = "oidc"
+)
+
+// UserIdentity links a user to their account at an external identity provider.
+// Users are matched on the provider's issuer and subject rather than the username,
+// which the provider may let people change.
+type UserIdentity struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	Provider    string     `gorm:"size:50;not null" json:"provider"`
+	Issuer      string     `gorm:"size:500;not null;uniqueIndex:idx_user_identity_subject" json:"issuer"`
+	Subject     string     `gorm:"size:255;not null;uniqueIndex:idx_user_identity_subject" json:"subject"`
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// TableName specifies the table name for UserIdentity
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
@@ -0,0 +1,183 @@
+// Package model provides data models for synthetic monitoring
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SyntheticCheckType is the protocol a synthetic check probes
+type SyntheticCheckType string
+
+const (
+	SyntheticCheckHTTP SyntheticCheckType = "http" // Target is an http or https URL
+	SyntheticCheckTCP  SyntheticCheckType = "tcp"  // Target is host:port
+	SyntheticCheckICMP SyntheticCheckType = "icmp" // Target is a host name or address
+)
+
+// SyntheticLocationGateway is the location of probes run by the gateway itself.
+// Other locations are the IDs of hosts whose agents run the probe.
+const SyntheticLocationGateway = "gateway"
+
+// SyntheticCheckStatus is the aggregated state of a check over its locations
+type SyntheticCheckStatus string
+
+const (
+	SyntheticCheckUp       SyntheticCheckStatus = "up"
+	SyntheticCheckDegraded SyntheticCheckStatus = "degraded" // Some locations fail, fewer than the threshold
+	SyntheticCheckDown     SyntheticCheckStatus = "down"
+	SyntheticCheckUnknown  SyntheticCheckStatus = "unknown" // Not run yet
+)
+
+// SyntheticCheck is a black-box probe of an endpoint run on an interval from one
+// or more locations. The check is down when at least FailureThreshold
+// locations fail, which fires its alert rule through the alert pipeline.
+type SyntheticCheck struct {
+	ID        uuid.UUID          `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID          `json:"userId" gorm:"type:uuid;not null;index"`
+	Name      string             `json:"name" gorm:"type:varchar(255);not null"`
+	Type      SyntheticCheckType `json:"type" gorm:"type:varchar(10);not null"`
+	Target    string             `json:"target" gorm:"type:varchar(2048);not null"`
+	Method    string             `json:"method,omitempty" gorm:"type:varchar(10)"` // http checks; GET when empty
+	Interval  int                `json:"interval" gorm:"not null"`                 // seconds
+	Timeout   int                `json:"timeout" gorm:"not null"`                  // seconds
+	Locations string             `json:"-" gorm:"type:jsonb"`                      // JSON array of locations
+	// Assertions
+	ExpectedStatus string `json:"expectedStatus,omitempty" gorm:"type:varchar(100)"` // http checks, e.g. 200-299,301; 2xx and 3xx when empty
+	BodyRegex      string `json:"bodyRegex,omitempty" gorm:"type:text"`              // http checks
+	MaxLatency     int    `json:"maxLatency,omitempty"`                              // milliseconds; 0 does not assert latency
+	// Alerting
+	FailureThreshold int           `json:"failureThreshold" gorm:"not null;default:1"` // Failing locations that make the check down
+	Severity         AlertSeverity `json:"severity" gorm:"type:varchar(20);not null"`
+	AlertRuleID      uuid.UUID     `json:"alertRuleId" gorm:"type:uuid"`
+	Enabled          bool          `json:"enabled" gorm:"default:true"`
+	// Last run
+	Status        SyntheticCheckStatus `json:"status" gorm:"type:varchar(20);not null;default:unknown"`
+	FailingCount  int                  `json:"failingCount"`
+	LastLatency   *int64               `json:"lastLatency,omitempty"` // milliseconds, the slowest succeeding location
+	LastError     string               `json:"lastError,omitempty" gorm:"type:text"`
+	LastCheckedAt *time.Time           `json:"lastCheckedAt,omitempty"`
+	NextRunAt     *time.Time           `json:"nextRunAt,omitempty" gorm:"index"` // Empty when disabled
+	CreatedAt     time.Time            `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time            `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for SyntheticCheck
+func (SyntheticCheck) TableName() string {
+	return "synthetic_checks"
+}
+
+// SyntheticCheckResponse is a check with its locations decoded
+type SyntheticCheckResponse struct {
+	SyntheticCheck
+	Locations []string `json:"locations"`
+}
+
+// Response decodes the check's locations
+func (c *SyntheticCheck) Response() SyntheticCheckResponse {
+	resp := SyntheticCheckResponse{SyntheticCheck: *c, Locations: []string{}}
+	if c.Locations != "" {
+		json.Unmarshal([]byte(c.Locations), &resp.Locations)
+	}
+	return resp
+}
+
+// SyntheticResult is the outcome of one probe of a check from one location
+type SyntheticResult struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CheckID    uuid.UUID `json:"checkId" gorm:"type:uuid;not null;index:idx_synthetic_results_check_time"`
+	Location   string    `json:"location" gorm:"type:varchar(64);not null"`
+	Success    bool      `json:"success"`
+	Latency    int64     `json:"latency"`                          // milliseconds
+	StatusCode int       `json:"statusCode,omitempty"`             // http checks
+	Error      string    `json:"error,omitempty" gorm:"type:text"` // Why the probe or an assertion failed
+	CheckedAt  time.Time `json:"checkedAt" gorm:"not null;index:idx_synthetic_results_check_time"`
+}
+
+// TableName specifies the table name for SyntheticResult
+func (SyntheticResult) TableName() string {
+	return "synthetic_results"
+}
+
+// SyntheticProbeSpec is what a location probes; agents get it as the args of
+// a synthetic_probe command
+type SyntheticProbeSpec struct {
+	Type      SyntheticCheckType `json:"type"`
+	Target    string             `json:"target"`
+	Method    string             `json:"method,omitempty"`
+	Timeout   int                `json:"timeout"`             // seconds
+	BodyRegex string             `json:"bodyRegex,omitempty"` // Matched against the first MiB of the body
+}
+
+// SyntheticProbeResult is what a probe measured. Assertions on the status code
+// and latency are made by the gateway.
+type SyntheticProbeResult struct {
+	Latency     int64  `json:"latency"` // milliseconds
+	StatusCode  int    `json:"statusCode,omitempty"`
+	BodyMatched *bool  `json:"bodyMatched,omitempty"` // Whether the body matched the spec's regex
+	Error       string `json:"error,omitempty"`       // Empty when the endpoint answered
+}
+
+// CreateSyntheticCheckRequest is a request to add a synthetic check
+type CreateSyntheticCheckRequest struct {
+	Name             string             `json:"name"`
+	Type             SyntheticCheckType `json:"type"`
+	Target           string             `json:"target"`
+	Method           string             `json:"method,omitempty"`
+	Interval         int                `json:"interval,omitempty"`  // seconds; a minute when omitted
+	Timeout          int                `json:"timeout,omitempty"`   // seconds; 10 when omitted
+	Locations        []string           `json:"locations,omitempty"` // The gateway when empty
+	ExpectedStatus   string             `json:"expectedStatus,omitempty"`
+	BodyRegex        string             `json:"bodyRegex,omitempty"`
+	MaxLatency       int                `json:"maxLatency,omitempty"`
+	FailureThreshold int                `json:"failureThreshold,omitempty"` // 1 when omitted
+	Severity         AlertSeverity      `json:"severity,omitempty"`         // critical when omitted
+	Enabled          *bool              `json:"enabled,omitempty"`          // true when omitted
+}
+
+// UpdateSyntheticCheckRequest changes the given fields of a check
+type UpdateSyntheticCheckRequest struct {
+	Name             *string        `json:"name,omitempty"`
+	Target           *string        `json:"target,omitempty"`
+	Method           *string        `json:"method,omitempty"`
+	Interval         *int           `json:"interval,omitempty"`
+	Timeout          *int           `json:"timeout,omitempty"`
+	Locations        *[]string      `json:"locations,omitempty"`
+	ExpectedStatus   *string        `json:"expectedStatus,omitempty"`
+	BodyRegex        *string        `json:"bodyRegex,omitempty"`
+	MaxLatency       *int           `json:"maxLatency,omitempty"`
+	FailureThreshold *int           `json:"failureThreshold,omitempty"`
+	Severity         *AlertSeverity `json:"severity,omitempty"`
+	Enabled          *bool          `json:"enabled,omitempty"`
+}
+
+// SyntheticResultFilter selects results of a check
+type SyntheticResultFilter struct {
+	Location string
+	Success  *bool
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+	Offset   int
+}
+
+// SyntheticUptime is the uptime of a check over a period, overall and per location
+type SyntheticUptime struct {
+	CheckID   uuid.UUID                 `json:"checkId"`
+	Since     time.Time                 `json:"since"`
+	Until     time.Time                 `json:"until"`
+	Overall   SyntheticLocationUptime   `json:"overall"` // The share of runs the check was not down
+	Locations []SyntheticLocationUptime `json:"locations"`
+}
+
+// SyntheticLocationUptime counts the probes of a location over a period
+type SyntheticLocationUptime struct {
+	Location   string  `json:"location"`
+	Probes     int64   `json:"probes"`
+	Successes  int64   `json:"successes"`
+	Uptime     float64 `json:"uptime"`     // percent; 100 without probes
+	AvgLatency float64 `json:"avgLatency"` // milliseconds, of succeeding probes
+	MaxLatency int64   `json:"maxLatency"`
+}
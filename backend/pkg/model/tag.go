@@ -0,0 +1,133 @@
+// Package model provides data models for tags on platform resources
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TagResourceType is a kind of resource tags can be attached to. Hosts are
+// tagged with their own labels instead.
+type TagResourceType string
+
+const (
+	TagResourceCluster     TagResourceType = "cluster"
+	TagResourceDataSource  TagResourceType = "data_source" // Prometheus data source
+	TagResourceDashboard   TagResourceType = "dashboard"   // Grafana dashboard
+	TagResourceAlertRule   TagResourceType = "alert_rule"
+	TagResourceHelmRelease TagResourceType = "helm_release"
+)
+
+// TagResourceTypes lists every kind of resource that can be tagged
+var TagResourceTypes = []TagResourceType{
+	TagResourceCluster,
+	TagResourceDataSource,
+	TagResourceDashboard,
+	TagResourceAlertRule,
+	TagResourceHelmRelease,
+}
+
+// Valid reports whether t is a kind of resource that can be tagged
+func (t TagResourceType) Valid() bool {
+	for _, known := range TagResourceTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ResourceTag is one key=value tag on a resource. Keys and values follow the
+// rules of Kubernetes labels, and a resource has at most one value per key.
+type ResourceTag struct {
+	ID           uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ResourceType TagResourceType `json:"resourceType" gorm:"type:varchar(32);not null;uniqueIndex:idx_resource_tags_resource_key,priority:1"`
+	ResourceID   uuid.UUID       `json:"resourceId" gorm:"type:uuid;not null;uniqueIndex:idx_resource_tags_resource_key,priority:2"`
+	Key          string          `json:"key" gorm:"type:varchar(317);not null;uniqueIndex:idx_resource_tags_resource_key,priority:3"`
+	Value        string          `json:"value" gorm:"type:varchar(63);not null"`
+	CreatedBy    *uuid.UUID      `json:"createdBy,omitempty" gorm:"type:uuid"`
+	CreatedAt    time.Time       `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time       `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for ResourceTag
+func (ResourceTag) TableName() string {
+	return "resource_tags"
+}
+
+// TaggedResource identifies a resource tags are attached to
+type TaggedResource struct {
+	Type TagResourceType `json:"type"`
+	ID   uuid.UUID       `json:"id"`
+}
+
+// SetTagsRequest replaces every tag of a resource
+type SetTagsRequest struct {
+	Tags map[string]string `json:"tags"`
+}
+
+// BulkTagRequest adds and removes tags on many resources at once. Added tags
+// overwrite the value of a key the resource already has.
+type BulkTagRequest struct {
+	Resources []TaggedResource  `json:"resources"`
+	Add       map[string]string `json:"add,omitempty"`
+	Remove    []string          `json:"remove,omitempty"` // Keys
+}
+
+// BulkTagFailure is a resource a bulk tag operation skipped
+type BulkTagFailure struct {
+	Resource TaggedResource `json:"resource"`
+	Error    string         `json:"error"`
+}
+
+// BulkTagResult is the outcome of a bulk tag operation
+type BulkTagResult struct {
+	Updated int              `json:"updated"`
+	Failed  []BulkTagFailure `json:"failed,omitempty"`
+}
+
+// TagKey is a tag key in use and the values it has, for suggesting tags
+type TagKey struct {
+	Key    string   `json:"key"`
+	Values []string `json:"values"`
+	Count  int64    `json:"count"` // Resources with the key
+}
+
+// PermissionTargetTags returns the tags access policy selectors are matched
+// against: the labels of a host, or the tags of any other resource. A target
+// without a resource has no tags.
+func PermissionTargetTags(db *gorm.DB, target PermissionTarget) (map[string]string, error) {
+	tags := map[string]string{}
+	if target.ResourceID == nil {
+		return tags, nil
+	}
+
+	if target.ResourceType == "host" {
+		var host Host
+		err := db.Select("labels").Where("id = ?", *target.ResourceID).Take(&host).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tags, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range host.Labels {
+			tags[key] = value
+		}
+		return tags, nil
+	}
+
+	var rows []ResourceTag
+	if err := db.Select("key", "value").
+		Where("resource_type = ? AND resource_id = ?", target.ResourceType, *target.ResourceID).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		tags[row.Key] = row.Value
+	}
+	return tags, nil
+}
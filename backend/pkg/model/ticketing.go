@@ -0,0 +1,148 @@
+// Package model provides data models for ticketing system integrations
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TicketProvider is the ticketing system an integration opens issues in
+type TicketProvider string
+
+const (
+	TicketProviderJira       TicketProvider = "jira"
+	TicketProviderServiceNow TicketProvider = "servicenow"
+)
+
+// TicketIntegration opens, updates and resolves issues in a Jira project or
+// ServiceNow table as alerts fire and resolve, and resolves alerts whose issue
+// is closed when SyncStatus is on
+type TicketIntegration struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	UserID   uuid.UUID      `gorm:"type:uuid;not null;index:idx_ticket_integration_user_id" json:"userId"`
+	Name     string         `gorm:"size:255;not null" json:"name"`
+	Provider TicketProvider `gorm:"size:20;not null" json:"provider"`
+	BaseURL  string         `gorm:"size:2048;not null" json:"baseUrl"`
+	Username string         `gorm:"size:255" json:"username,omitempty"` // Empty sends Token as a bearer token
+	Token    string         `gorm:"type:text;not null" json:"-"`        // API token or password, never exposed
+	Enabled  bool           `gorm:"default:true" json:"enabled"`
+
+	// Mapping of alerts to issues
+	Project             string `gorm:"size:255" json:"project,omitempty"`           // Jira project key, or ServiceNow assignment group
+	IssueType           string `gorm:"size:255" json:"issueType,omitempty"`         // Jira issue type, or ServiceNow table
+	Severities          string `gorm:"type:text" json:"-"`                          // JSON array of AlertSeverity; every severity when empty
+	SummaryTemplate     string `gorm:"type:text" json:"summaryTemplate"`            // Go text/template over the alert
+	DescriptionTemplate string `gorm:"type:text" json:"descriptionTemplate"`        // Go text/template over the alert
+	Fields              string `gorm:"type:text" json:"-"`                          // JSON object of provider field -> template
+	ResolveTransition   string `gorm:"size:255" json:"resolveTransition,omitempty"` // Jira transition name, or ServiceNow state
+
+	// Status sync back from the ticketing system
+	SyncStatus       bool       `gorm:"default:true" json:"syncStatus"`
+	InboundTokenHash string     `gorm:"size:64;index" json:"-"` // SHA-256 of the token inbound webhooks present
+	LastSyncedAt     *time.Time `json:"lastSyncedAt,omitempty"`
+}
+
+// TableName specifies the table name for TicketIntegration
+func (TicketIntegration) TableName() string {
+	return "ticket_integrations"
+}
+
+// TicketIntegrationResponse is an integration with its decoded mapping
+type TicketIntegrationResponse struct {
+	TicketIntegration
+	Severities []AlertSeverity   `json:"severities"`
+	Fields     map[string]string `json:"fields"`
+}
+
+// Response decodes the integration's mapping
+func (i *TicketIntegration) Response() TicketIntegrationResponse {
+	resp := TicketIntegrationResponse{
+		TicketIntegration: *i,
+		Severities:        []AlertSeverity{},
+		Fields:            map[string]string{},
+	}
+	if i.Severities != "" {
+		json.Unmarshal([]byte(i.Severities), &resp.Severities)
+	}
+	if i.Fields != "" {
+		json.Unmarshal([]byte(i.Fields), &resp.Fields)
+	}
+	return resp
+}
+
+// AlertTicketStatus is where an alert's issue is in its lifecycle
+type AlertTicketStatus string
+
+const (
+	AlertTicketOpen     AlertTicketStatus = "open"
+	AlertTicketResolved AlertTicketStatus = "resolved" // Resolved by the alert, or closed in the ticketing system
+)
+
+// AlertTicket links an alert to the issue an integration opened for it
+type AlertTicket struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	AlertID       uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_alert_ticket_alert_integration" json:"alertId"`
+	IntegrationID uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_alert_ticket_alert_integration;index" json:"integrationId"`
+	Provider      TicketProvider `gorm:"size:20;not null" json:"provider"`
+
+	ExternalID     string            `gorm:"size:255;not null;index" json:"externalId"` // Jira issue ID, or ServiceNow sys_id
+	ExternalKey    string            `gorm:"size:255;not null" json:"externalKey"`      // Jira issue key, or ServiceNow number
+	URL            string            `gorm:"size:2048" json:"url"`
+	ExternalStatus string            `gorm:"size:255" json:"externalStatus,omitempty"`
+	Status         AlertTicketStatus `gorm:"size:20;not null;index" json:"status"`
+	LastSyncedAt   *time.Time        `json:"lastSyncedAt,omitempty"`
+	Error          string            `gorm:"type:text" json:"error,omitempty"` // Latest failed update
+}
+
+// TableName specifies the table name for AlertTicket
+func (AlertTicket) TableName() string {
+	return "alert_tickets"
+}
+
+// CreateTicketIntegrationRequest represents a request to create a ticketing integration
+type CreateTicketIntegrationRequest struct {
+	Name                string            `json:"name"`
+	Provider            TicketProvider    `json:"provider"`
+	BaseURL             string            `json:"baseUrl"`
+	Username            string            `json:"username,omitempty"`
+	Token               string            `json:"token"`
+	Enabled             *bool             `json:"enabled,omitempty"`
+	Project             string            `json:"project,omitempty"`
+	IssueType           string            `json:"issueType,omitempty"`
+	Severities          []AlertSeverity   `json:"severities,omitempty"`
+	SummaryTemplate     string            `json:"summaryTemplate,omitempty"`
+	DescriptionTemplate string            `json:"descriptionTemplate,omitempty"`
+	Fields              map[string]string `json:"fields,omitempty"`
+	ResolveTransition   string            `json:"resolveTransition,omitempty"`
+	SyncStatus          *bool             `json:"syncStatus,omitempty"`
+}
+
+// UpdateTicketIntegrationRequest represents a request to update a ticketing integration
+type UpdateTicketIntegrationRequest struct {
+	Name                *string            `json:"name,omitempty"`
+	BaseURL             *string            `json:"baseUrl,omitempty"`
+	Username            *string            `json:"username,omitempty"`
+	Token               *string            `json:"token,omitempty"`
+	Enabled             *bool              `json:"enabled,omitempty"`
+	Project             *string            `json:"project,omitempty"`
+	IssueType           *string            `json:"issueType,omitempty"`
+	Severities          *[]AlertSeverity   `json:"severities,omitempty"`
+	SummaryTemplate     *string            `json:"summaryTemplate,omitempty"`
+	DescriptionTemplate *string            `json:"descriptionTemplate,omitempty"`
+	Fields              *map[string]string `json:"fields,omitempty"`
+	ResolveTransition   *string            `json:"resolveTransition,omitempty"`
+	SyncStatus          *bool              `json:"syncStatus,omitempty"`
+}
+
+// OpenAlertTicketRequest represents a request to open an issue for an alert by hand
+type OpenAlertTicketRequest struct {
+	IntegrationID uuid.UUID `json:"integrationId"`
+}
@@ -0,0 +1,115 @@
+// Package model provides data models for the cluster and host topology map
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TopologyKind is the kind of resource a topology node stands for
+type TopologyKind string
+
+const (
+	TopologyKindCluster TopologyKind = "cluster"
+	TopologyKindNode    TopologyKind = "node"
+	TopologyKindPod     TopologyKind = "pod"
+	TopologyKindService TopologyKind = "service"
+	TopologyKindHost    TopologyKind = "host"
+)
+
+// TopologyHealth summarizes a node's own status and its open alerts and anomalies
+type TopologyHealth string
+
+const (
+	TopologyHealthUnknown  TopologyHealth = "unknown"
+	TopologyHealthHealthy  TopologyHealth = "healthy"
+	TopologyHealthWarning  TopologyHealth = "warning"
+	TopologyHealthCritical TopologyHealth = "critical"
+)
+
+// Rank orders health levels from unknown to critical
+func (h TopologyHealth) Rank() int {
+	switch h {
+	case TopologyHealthHealthy:
+		return 1
+	case TopologyHealthWarning:
+		return 2
+	case TopologyHealthCritical:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Topology edge kinds
+const (
+	TopologyEdgeContains = "contains" // cluster to node, or to pod for namespace-scoped views
+	TopologyEdgeRuns     = "runs"     // node to pod
+	TopologyEdgeSelects  = "selects"  // service to pod
+	TopologyEdgeMachine  = "machine"  // managed host to the node it is
+)
+
+// TopologyNode is a resource on the topology map. IDs are stable across builds so
+// updates can be applied to a map already drawn.
+type TopologyNode struct {
+	ID         string            `json:"id"`
+	Kind       TopologyKind      `json:"kind"`
+	Name       string            `json:"name"`
+	ClusterID  *uuid.UUID        `json:"clusterId,omitempty"`
+	HostID     *uuid.UUID        `json:"hostId,omitempty"`
+	Namespace  string            `json:"namespace,omitempty"`
+	Status     string            `json:"status"`
+	Health     TopologyHealth    `json:"health"`
+	Alerts     int               `json:"alerts"`    // firing alerts
+	Anomalies  int               `json:"anomalies"` // active and acknowledged anomalies
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// TopologyEdge links two topology nodes
+type TopologyEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Kind   string `json:"kind"`
+}
+
+// TopologyFilter narrows a topology graph. Clusters are kept whatever the filter
+// so the rest of the map has somewhere to hang.
+type TopologyFilter struct {
+	ClusterIDs []uuid.UUID
+	Namespace  string
+	Kinds      []TopologyKind
+	MinHealth  TopologyHealth // keep only nodes at least this unhealthy
+	Hosts      bool           // include managed hosts
+}
+
+// TopologySource is the state of one part of the map: a cluster, or the managed
+// hosts when ClusterID is nil
+type TopologySource struct {
+	ClusterID   *uuid.UUID `json:"clusterId,omitempty"`
+	ClusterName string     `json:"clusterName,omitempty"`
+	Revision    int64      `json:"revision"`
+	BuiltAt     time.Time  `json:"builtAt"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// TopologyGraph is the topology map as one user may see it
+type TopologyGraph struct {
+	Nodes     []TopologyNode   `json:"nodes"`
+	Edges     []TopologyEdge   `json:"edges"`
+	Sources   []TopologySource `json:"sources"`
+	Truncated bool             `json:"truncated"` // nodes beyond the limit were left out
+}
+
+// TopologyDelta is the change to one source of the map between two revisions,
+// published with topology.changed. Clients holding PreviousRevision apply it;
+// others refetch the graph.
+type TopologyDelta struct {
+	ClusterID        *uuid.UUID     `json:"clusterId,omitempty"`
+	PreviousRevision int64          `json:"previousRevision"`
+	Revision         int64          `json:"revision"`
+	Upserted         []TopologyNode `json:"upserted,omitempty"`
+	Removed          []string       `json:"removed,omitempty"`
+	AddedEdges       []TopologyEdge `json:"addedEdges,omitempty"`
+	RemovedEdges     []TopologyEdge `json:"removedEdges,omitempty"`
+}
@@ -0,0 +1,135 @@
+// Package model provides data models for distributed tracing backends
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TraceBackendType represents the kind of tracing backend
+type TraceBackendType string
+
+const (
+	TraceBackendTempo  TraceBackendType = "tempo"
+	TraceBackendJaeger TraceBackendType = "jaeger"
+)
+
+// IsValid reports whether the backend type is supported
+func (t TraceBackendType) IsValid() bool {
+	return t == TraceBackendTempo || t == TraceBackendJaeger
+}
+
+// TraceDataSource represents a Tempo or Jaeger query endpoint
+type TraceDataSource struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	UserID    uuid.UUID        `gorm:"type:uuid;not null;index:idx_trace_ds_user_id" json:"userId"`
+	ClusterID *uuid.UUID       `gorm:"type:uuid;index:idx_trace_ds_cluster_id" json:"clusterId,omitempty"`
+	Name      string           `gorm:"size:255;not null" json:"name"`
+	Type      TraceBackendType `gorm:"size:20;not null" json:"type"`
+	URL       string           `gorm:"size:2048;not null" json:"url"`
+	Username  string           `gorm:"size:255" json:"username,omitempty"`
+	Password  string           `gorm:"size:255" json:"-"`                  // Never expose in JSON
+	Token     string           `gorm:"size:2048" json:"-"`                 // Bearer token, never exposed
+	TenantID  string           `gorm:"size:255" json:"tenantId,omitempty"` // X-Scope-OrgID for multi-tenant Tempo
+	Status    string           `gorm:"size:50;default:active" json:"status"`
+
+	InsecureSkipTLS bool   `gorm:"default:false" json:"insecureSkipTLS"`
+	Headers         string `gorm:"type:text" json:"headers,omitempty"` // JSON object of extra request headers
+
+	// Test results
+	LastTestAt     *time.Time `json:"lastTestAt,omitempty"`
+	LastTestStatus string     `gorm:"size:50" json:"lastTestStatus,omitempty"`
+	LastTestError  string     `gorm:"type:text" json:"lastTestError,omitempty"`
+
+	// Relationships
+	Cluster *K8sCluster `gorm:"foreignKey:ClusterID" json:"cluster,omitempty"`
+}
+
+// TableName specifies the table name for TraceDataSource
+func (TraceDataSource) TableName() string {
+	return "trace_data_sources"
+}
+
+// CreateTraceDataSourceRequest represents a request to create a trace data source
+type CreateTraceDataSourceRequest struct {
+	ClusterID       *uuid.UUID       `json:"clusterId,omitempty"`
+	Name            string           `json:"name"`
+	Type            TraceBackendType `json:"type"`
+	URL             string           `json:"url"`
+	Username        string           `json:"username,omitempty"`
+	Password        string           `json:"password,omitempty"`
+	Token           string           `json:"token,omitempty"`
+	TenantID        string           `json:"tenantId,omitempty"`
+	InsecureSkipTLS bool             `json:"insecureSkipTLS,omitempty"`
+	Headers         string           `json:"headers,omitempty"`
+}
+
+// UpdateTraceDataSourceRequest represents a request to update a trace data source
+type UpdateTraceDataSourceRequest struct {
+	Name            *string `json:"name,omitempty"`
+	URL             *string `json:"url,omitempty"`
+	Username        *string `json:"username,omitempty"`
+	Password        *string `json:"password,omitempty"`
+	Token           *string `json:"token,omitempty"`
+	TenantID        *string `json:"tenantId,omitempty"`
+	InsecureSkipTLS *bool   `json:"insecureSkipTLS,omitempty"`
+	Headers         *string `json:"headers,omitempty"`
+	Status          *string `json:"status,omitempty"`
+}
+
+// TraceSearchQuery filters a trace search
+type TraceSearchQuery struct {
+	Service     string            `json:"service,omitempty"`
+	Operation   string            `json:"operation,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	MinDuration time.Duration     `json:"minDuration,omitempty"`
+	MaxDuration time.Duration     `json:"maxDuration,omitempty"`
+	Start       time.Time         `json:"start"`
+	End         time.Time         `json:"end"`
+	Limit       int               `json:"limit"`
+}
+
+// TraceSummary is one trace in search results
+type TraceSummary struct {
+	TraceID       string    `json:"traceId"`
+	RootService   string    `json:"rootService"`
+	RootOperation string    `json:"rootOperation"`
+	StartTime     time.Time `json:"startTime"`
+	DurationMs    float64   `json:"durationMs"`
+	SpanCount     int       `json:"spanCount,omitempty"`
+	ErrorCount    int       `json:"errorCount"`
+	Services      []string  `json:"services,omitempty"`
+}
+
+// Span is a single operation within a trace
+type Span struct {
+	SpanID       string            `json:"spanId"`
+	ParentSpanID string            `json:"parentSpanId,omitempty"`
+	Service      string            `json:"service"`
+	Operation    string            `json:"operation"`
+	StartTime    time.Time         `json:"startTime"`
+	DurationMs   float64           `json:"durationMs"`
+	Error        bool              `json:"error"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+}
+
+// Trace is a complete trace with its spans ordered by start time
+type Trace struct {
+	TraceID string       `json:"traceId"`
+	Summary TraceSummary `json:"summary"`
+	Spans   []Span       `json:"spans"`
+}
+
+// AnomalyTraceCandidates lists traces that may explain an anomaly, most suspicious first
+type AnomalyTraceCandidates struct {
+	AnomalyID    uuid.UUID      `json:"anomalyId"`
+	DataSourceID uuid.UUID      `json:"dataSourceId"`
+	Service      string         `json:"service,omitempty"`
+	WindowStart  time.Time      `json:"windowStart"`
+	WindowEnd    time.Time      `json:"windowEnd"`
+	Traces       []TraceSummary `json:"traces"`
+}
@@ -0,0 +1,84 @@
+// Package model provides data models for cluster upgrade assessments
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UpgradeAssessmentStatus is the state of an upgrade assessment
+type UpgradeAssessmentStatus string
+
+const (
+	UpgradeAssessmentPending   UpgradeAssessmentStatus = "pending" // Queued for the scan
+	UpgradeAssessmentCompleted UpgradeAssessmentStatus = "completed"
+	UpgradeAssessmentFailed    UpgradeAssessmentStatus = "failed"
+)
+
+// Upgrade finding severities
+const (
+	UpgradeSeverityCritical = "critical" // The API is no longer served by the target version
+	UpgradeSeverityWarning  = "warning"  // The API is deprecated in the target version and removed later
+)
+
+// DeprecatedAPIFinding is an object in the cluster or a Helm release manifest
+// that uses a deprecated API version
+type DeprecatedAPIFinding struct {
+	Severity     string `json:"severity"`
+	Source       string `json:"source"` // live or helm
+	APIVersion   string `json:"apiVersion"`
+	Kind         string `json:"kind"`
+	Name         string `json:"name"`
+	Namespace    string `json:"namespace,omitempty"`
+	Release      string `json:"release,omitempty"` // Helm release, namespace/name
+	Manager      string `json:"manager,omitempty"` // Field manager that wrote the version, for live objects
+	DeprecatedIn string `json:"deprecatedIn"`
+	RemovedIn    string `json:"removedIn"`
+	Replacement  string `json:"replacement,omitempty"` // apiVersion to migrate to
+	Notes        string `json:"notes,omitempty"`
+}
+
+// ClusterUpgradeAssessment is a scan of a cluster for the deprecated APIs that
+// block or will block upgrading it to a target Kubernetes version
+type ClusterUpgradeAssessment struct {
+	ID             uuid.UUID               `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
+	ClusterID      uuid.UUID               `json:"clusterId" gorm:"type:uuid;not null;index"`
+	ClusterName    string                  `json:"clusterName" gorm:"type:varchar(255)"`
+	TriggeredBy    *uuid.UUID              `json:"triggeredBy,omitempty" gorm:"type:uuid"`
+	CurrentVersion string                  `json:"currentVersion" gorm:"type:varchar(50)"` // Server version when scanned
+	TargetVersion  string                  `json:"targetVersion" gorm:"type:varchar(50);not null"`
+	Status         UpgradeAssessmentStatus `json:"status" gorm:"type:varchar(20);not null"`
+	Critical       int                     `json:"critical"`
+	Warnings       int                     `json:"warnings"`
+	Findings       string                  `json:"-" gorm:"type:jsonb"` // JSON array of DeprecatedAPIFinding
+	Error          string                  `json:"error,omitempty" gorm:"type:text"`
+	CompletedAt    *time.Time              `json:"completedAt,omitempty"`
+	CreatedAt      time.Time               `json:"createdAt" gorm:"autoCreateTime;index"`
+}
+
+// TableName specifies the table name for ClusterUpgradeAssessment
+func (ClusterUpgradeAssessment) TableName() string {
+	return "cluster_upgrade_assessments"
+}
+
+// ClusterUpgradeAssessmentResponse is an assessment with its findings
+type ClusterUpgradeAssessmentResponse struct {
+	ClusterUpgradeAssessment
+	Findings []DeprecatedAPIFinding `json:"findings"`
+}
+
+// Response decodes the assessment's findings
+func (a *ClusterUpgradeAssessment) Response() ClusterUpgradeAssessmentResponse {
+	resp := ClusterUpgradeAssessmentResponse{ClusterUpgradeAssessment: *a, Findings: []DeprecatedAPIFinding{}}
+	if a.Findings != "" {
+		json.Unmarshal([]byte(a.Findings), &resp.Findings)
+	}
+	return resp
+}
+
+// RunUpgradeAssessmentRequest represents a request to assess a cluster for an upgrade
+type RunUpgradeAssessmentRequest struct {
+	TargetVersion string `json:"targetVersion"` // e.g. 1.29; the next minor release when empty
+}
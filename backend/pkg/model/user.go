@@ -22,6 +22,8 @@ type User struct {
 	Position     string    `gorm:"type:varchar(255)" json:"position"`
 	IsActive     bool      `gorm:"default:true" json:"is_active"`
 	LastLoginAt  *time.Time `json:"last_login_at"`
+	FailedLoginCount int        `gorm:"default:0" json:"failed_login_count"`
+	LockedUntil      *time.Time `json:"locked_until,omitempty"`
 	CreatedAt    time.Time `gorm:"default:now()" json:"created_at"`
 	UpdatedAt    time.Time `gorm:"default:now()" json:"updated_at"`
 	Roles        []Role    `gorm:"many2many:user_roles;" json:"roles,omitempty"`
@@ -42,6 +44,7 @@ func (u *User) BeforeUpdate(tx *gorm.DB) error {
 const (
 	UserTypeLocal = "local"
 	UserTypeLDAP  = "ldap"
+	UserTypeOIDC  = "oidc"
 )
 
 // Role represents a role in the system
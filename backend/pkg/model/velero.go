@@ -0,0 +1,59 @@
+// Package model provides data models for Velero installations in managed clusters
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VeleroProvider is the object storage and snapshot provider Velero is configured for
+type VeleroProvider string
+
+const (
+	VeleroProviderAWS   VeleroProvider = "aws" // S3 and S3-compatible storage such as MinIO
+	VeleroProviderGCP   VeleroProvider = "gcp"
+	VeleroProviderAzure VeleroProvider = "azure"
+)
+
+// VeleroInstallation is the Velero configuration the platform installed in a
+// cluster through its Helm release
+type VeleroInstallation struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ClusterID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"clusterId"`
+	ReleaseID uuid.UUID `gorm:"type:uuid;not null" json:"releaseId"` // HelmRelease of the chart
+	CreatedBy uuid.UUID `gorm:"type:uuid;not null" json:"createdBy"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	Namespace        string         `gorm:"size:63;not null" json:"namespace"`
+	ChartVersion     string         `gorm:"size:50" json:"chartVersion,omitempty"`
+	Provider         VeleroProvider `gorm:"size:20;not null" json:"provider"`
+	Bucket           string         `gorm:"size:255;not null" json:"bucket"`
+	Prefix           string         `gorm:"size:255" json:"prefix,omitempty"`
+	Region           string         `gorm:"size:50" json:"region,omitempty"`
+	S3URL            string         `gorm:"size:1024" json:"s3Url,omitempty"` // S3-compatible endpoint
+	Credentials      string         `gorm:"type:text" json:"-"`               // Provider credentials file
+	SnapshotsEnabled bool           `json:"snapshotsEnabled"`
+	DefaultTTL       string         `gorm:"size:20" json:"defaultTtl,omitempty"` // Backup retention, such as 720h
+}
+
+// TableName specifies the table name for VeleroInstallation
+func (VeleroInstallation) TableName() string {
+	return "velero_installations"
+}
+
+// InstallVeleroRequest installs or reconfigures Velero in a cluster. Credentials
+// are kept when omitted on a reconfiguration.
+type InstallVeleroRequest struct {
+	Namespace        string         `json:"namespace,omitempty"` // velero when omitted
+	ChartVersion     string         `json:"chartVersion,omitempty"`
+	Provider         VeleroProvider `json:"provider"`
+	Bucket           string         `json:"bucket"`
+	Prefix           string         `json:"prefix,omitempty"`
+	Region           string         `json:"region,omitempty"`
+	S3URL            string         `json:"s3Url,omitempty"`
+	Credentials      string         `json:"credentials,omitempty"`
+	SnapshotsEnabled bool           `json:"snapshotsEnabled,omitempty"`
+	DefaultTTL       string         `json:"defaultTtl,omitempty"`
+}
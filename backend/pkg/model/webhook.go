@@ -0,0 +1,115 @@
+// Package model provides data models for outbound webhooks
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebhookEndpoint is an external URL that receives signed event deliveries
+type WebhookEndpoint struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index:idx_webhook_endpoint_user_id" json:"userId"`
+	Name        string    `gorm:"size:255;not null" json:"name"`
+	Description string    `gorm:"type:text" json:"description,omitempty"`
+	URL         string    `gorm:"size:2048;not null" json:"url"`
+	Secret      string    `gorm:"size:255;not null" json:"-"` // HMAC-SHA256 signing key, never exposed
+	Enabled     bool      `gorm:"default:true" json:"enabled"`
+
+	// Subscription
+	Events  string `gorm:"type:text;not null" json:"-"` // JSON array of EventType
+	Filters string `gorm:"type:text" json:"-"`          // JSON object of attribute -> allowed values
+
+	MaxAttempts int `gorm:"default:8" json:"maxAttempts"`
+}
+
+// TableName specifies the table name for WebhookEndpoint
+func (WebhookEndpoint) TableName() string {
+	return "webhook_endpoints"
+}
+
+// WebhookEndpointResponse is an endpoint with its decoded subscription
+type WebhookEndpointResponse struct {
+	WebhookEndpoint
+	Events  []EventType         `json:"events"`
+	Filters map[string][]string `json:"filters"`
+}
+
+// Response decodes the endpoint's subscription
+func (e *WebhookEndpoint) Response() WebhookEndpointResponse {
+	resp := WebhookEndpointResponse{
+		WebhookEndpoint: *e,
+		Events:          []EventType{},
+		Filters:         map[string][]string{},
+	}
+	json.Unmarshal([]byte(e.Events), &resp.Events)
+	if e.Filters != "" {
+		json.Unmarshal([]byte(e.Filters), &resp.Filters)
+	}
+	return resp
+}
+
+// Webhook delivery status constants
+const (
+	WebhookDeliveryPending    = "pending"
+	WebhookDeliveryInProgress = "delivering"
+	WebhookDeliverySucceeded  = "succeeded"
+	WebhookDeliveryFailed     = "failed" // Retries exhausted
+)
+
+// WebhookDelivery is one event sent to one endpoint, with its latest attempt
+type WebhookDelivery struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	EndpointID uuid.UUID `gorm:"type:uuid;not null;index:idx_webhook_delivery_endpoint_id" json:"endpointId"`
+	EventID    uuid.UUID `gorm:"type:uuid;not null;index" json:"eventId"`
+	EventType  EventType `gorm:"size:100;not null" json:"eventType"`
+	Payload    string    `gorm:"type:text;not null" json:"payload"`
+
+	Status        string     `gorm:"size:20;not null;index:idx_webhook_delivery_due" json:"status"`
+	Attempts      int        `gorm:"default:0" json:"attempts"`
+	NextAttemptAt *time.Time `gorm:"index:idx_webhook_delivery_due" json:"nextAttemptAt,omitempty"`
+	LastAttemptAt *time.Time `json:"lastAttemptAt,omitempty"`
+
+	// Latest attempt
+	ResponseStatus int    `json:"responseStatus,omitempty"`
+	ResponseBody   string `gorm:"type:text" json:"responseBody,omitempty"`
+	Error          string `gorm:"type:text" json:"error,omitempty"`
+	DurationMs     int64  `json:"durationMs,omitempty"`
+}
+
+// TableName specifies the table name for WebhookDelivery
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// CreateWebhookEndpointRequest represents a request to create a webhook endpoint
+type CreateWebhookEndpointRequest struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	URL         string              `json:"url"`
+	Secret      string              `json:"secret,omitempty"` // Generated when empty
+	Events      []EventType         `json:"events"`
+	Filters     map[string][]string `json:"filters,omitempty"`
+	MaxAttempts int                 `json:"maxAttempts,omitempty"`
+	Enabled     *bool               `json:"enabled,omitempty"`
+}
+
+// UpdateWebhookEndpointRequest represents a request to update a webhook endpoint
+type UpdateWebhookEndpointRequest struct {
+	Name        *string              `json:"name,omitempty"`
+	Description *string              `json:"description,omitempty"`
+	URL         *string              `json:"url,omitempty"`
+	Secret      *string              `json:"secret,omitempty"`
+	Events      *[]EventType         `json:"events,omitempty"`
+	Filters     *map[string][]string `json:"filters,omitempty"`
+	MaxAttempts *int                 `json:"maxAttempts,omitempty"`
+	Enabled     *bool                `json:"enabled,omitempty"`
+}
@@ -0,0 +1,109 @@
+// Package sanitize escapes and validates user input before it reaches SQL
+// queries and Kubernetes API calls
+package sanitize
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	// ErrInvalidSort is returned for a sort field that is not whitelisted
+	ErrInvalidSort = errors.New("invalid sort field")
+	// ErrInvalidFilter is returned for a filter value that is not whitelisted
+	ErrInvalidFilter = errors.New("invalid filter value")
+	// ErrInvalidSelector is returned for a malformed label selector or label
+	ErrInvalidSelector = errors.New("invalid label selector")
+)
+
+// likeEscaper escapes the LIKE wildcards and the escape character itself, which
+// is a backslash in PostgreSQL unless the query names another
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike escapes s so it matches itself literally in a LIKE or ILIKE pattern
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// Contains returns a LIKE pattern matching values that contain s
+func Contains(s string) string {
+	return "%" + EscapeLike(s) + "%"
+}
+
+// SortColumns whitelists the fields a list may be sorted by, mapping each field
+// name clients send to its column
+type SortColumns map[string]string
+
+// Order returns the ORDER BY clause sorting by field, or ErrInvalidSort when the
+// field is not whitelisted
+func (c SortColumns) Order(field string, desc bool) (string, error) {
+	column, ok := c[field]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidSort, field)
+	}
+	if desc {
+		return column + " DESC", nil
+	}
+	return column + " ASC", nil
+}
+
+// OneOf checks that every value is one of allowed, returning ErrInvalidFilter
+// for the first that is not
+func OneOf(values []string, allowed ...string) error {
+	for _, value := range values {
+		found := false
+		for _, a := range allowed {
+			if value == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: %q", ErrInvalidFilter, value)
+		}
+	}
+	return nil
+}
+
+// LabelSelector parses a Kubernetes label selector, such as
+// "app=web,tier in (frontend)", and returns it in canonical form. Selectors that
+// do not parse, including ones smuggling extra requirements through label values,
+// return ErrInvalidSelector.
+func LabelSelector(selector string) (string, error) {
+	// The selector lexer stops at a NUL, which would drop what follows it
+	if i := strings.IndexFunc(selector, unicode.IsControl); i >= 0 {
+		return "", fmt.Errorf("%w: control character at position %d", ErrInvalidSelector, i)
+	}
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSelector, err)
+	}
+	return parsed.String(), nil
+}
+
+// Labels checks that labels are valid Kubernetes label keys and values
+func Labels(set map[string]string) error {
+	for key, value := range set {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("%w: key %q: %s", ErrInvalidSelector, key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("%w: value %q of %s: %s", ErrInvalidSelector, value, key, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// ResourceName checks that name is a valid Kubernetes object name, so it cannot
+// change the meaning of the field selectors and paths it is put in
+func ResourceName(name string) error {
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return fmt.Errorf("%w: name %q: %s", ErrInvalidSelector, name, strings.Join(errs, "; "))
+	}
+	return nil
+}
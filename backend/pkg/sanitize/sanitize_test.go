@@ -0,0 +1,144 @@
+package sanitize
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"web-01", "web-01"},
+		{"%", `\%`},
+		{"_", `\_`},
+		{"100%_done", `100\%\_done`},
+		{`C:\temp`, `C:\\temp`},
+		{`\%`, `\\\%`},
+		{"'; DROP TABLE hosts; --", "'; DROP TABLE hosts; --"},
+	}
+	for _, tt := range tests {
+		if got := EscapeLike(tt.input); got != tt.want {
+			t.Errorf("EscapeLike(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	if got := Contains("a%b"); got != `%a\%b%` {
+		t.Errorf("Contains(%q) = %q", "a%b", got)
+	}
+	// An empty search still matches everything
+	if got := Contains(""); got != "%%" {
+		t.Errorf("Contains(%q) = %q", "", got)
+	}
+}
+
+func TestSortColumnsOrder(t *testing.T) {
+	columns := SortColumns{"hostname": "hostname", "createdAt": "created_at"}
+
+	tests := []struct {
+		field   string
+		desc    bool
+		want    string
+		wantErr bool
+	}{
+		{field: "hostname", want: "hostname ASC"},
+		{field: "createdAt", desc: true, want: "created_at DESC"},
+		{field: "created_at", wantErr: true},
+		{field: "hostname; DROP TABLE hosts", wantErr: true},
+		{field: "hostname DESC, (SELECT 1)", wantErr: true},
+		{field: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := columns.Order(tt.field, tt.desc)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidSort) {
+				t.Errorf("Order(%q) error = %v, want ErrInvalidSort", tt.field, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Order(%q, %v) = %q, %v, want %q", tt.field, tt.desc, got, err, tt.want)
+		}
+	}
+}
+
+func TestOneOf(t *testing.T) {
+	if err := OneOf([]string{"online", "offline"}, "online", "offline", "pending"); err != nil {
+		t.Errorf("OneOf() error = %v", err)
+	}
+	for _, values := range [][]string{{"online", "x' OR '1'='1"}, {""}, {"ONLINE"}} {
+		if err := OneOf(values, "online", "offline"); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("OneOf(%q) error = %v, want ErrInvalidFilter", values, err)
+		}
+	}
+}
+
+func TestLabelSelector(t *testing.T) {
+	valid := map[string]string{
+		"app=web":                      "app=web",
+		"app = web, tier!=db":          "app=web,tier!=db",
+		"env in (prod,staging)":        "env in (prod,staging)",
+		"!canary":                      "!canary",
+		"app.kubernetes.io/name=myops": "app.kubernetes.io/name=myops",
+		"":                             "",
+	}
+	for selector, want := range valid {
+		got, err := LabelSelector(selector)
+		if err != nil || got != want {
+			t.Errorf("LabelSelector(%q) = %q, %v, want %q", selector, got, err, want)
+		}
+	}
+
+	invalid := []string{
+		"app=web)",
+		"app=web' OR '1'='1",
+		"app=$(rm -rf /)",
+		"app in (web",
+		"app==web==db",
+		"-app=web",
+		"app=" + strings.Repeat("a", 64),
+		"app=web\x00,tier=db",
+		"app=web\n",
+	}
+	for _, selector := range invalid {
+		if _, err := LabelSelector(selector); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("LabelSelector(%q) error = %v, want ErrInvalidSelector", selector, err)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	if err := Labels(map[string]string{"app": "web", "example.com/tier": "", "version": "v1.2_3"}); err != nil {
+		t.Errorf("Labels() error = %v", err)
+	}
+
+	invalid := []map[string]string{
+		{"app,tier": "web"},
+		{"app": "web,tier=db"},
+		{"app": "web tier"},
+		{"": "web"},
+		{"app": "-web"},
+	}
+	for _, set := range invalid {
+		if err := Labels(set); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("Labels(%v) error = %v, want ErrInvalidSelector", set, err)
+		}
+	}
+}
+
+func TestResourceName(t *testing.T) {
+	for _, name := range []string{"web-0", "web.example", "a"} {
+		if err := ResourceName(name); err != nil {
+			t.Errorf("ResourceName(%q) error = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "web,involvedObject.kind=Secret", "../etc", "Web", "web pod", "web=0"} {
+		if err := ResourceName(name); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("ResourceName(%q) error = %v, want ErrInvalidSelector", name, err)
+		}
+	}
+}
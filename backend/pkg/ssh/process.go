@@ -101,6 +101,36 @@ func (p *ProcessClient) KillProcess(pid int32, signal int32) error {
 	return nil
 }
 
+// ReniceProcess changes the CPU scheduling priority of a process
+func (p *ProcessClient) ReniceProcess(pid int32, priority int32) error {
+	cmd := fmt.Sprintf("renice -n %d -p %d", priority, pid)
+	output, err := p.client.ExecuteCommand(cmd, 10*time.Second)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to renice process %d", pid))
+	}
+	if output.ExitError != nil {
+		return fmt.Errorf("failed to renice process %d: %s", pid, strings.TrimSpace(output.Stderr))
+	}
+	return nil
+}
+
+// IoniceProcess changes the I/O scheduling class and level of a process
+func (p *ProcessClient) IoniceProcess(pid int32, class int32, level int32) error {
+	cmd := fmt.Sprintf("ionice -c %d -n %d -p %d", class, level, pid)
+	if class == 3 {
+		// The idle class takes no priority level
+		cmd = fmt.Sprintf("ionice -c 3 -p %d", pid)
+	}
+	output, err := p.client.ExecuteCommand(cmd, 10*time.Second)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to ionice process %d", pid))
+	}
+	if output.ExitError != nil {
+		return fmt.Errorf("failed to ionice process %d: %s", pid, strings.TrimSpace(output.Stderr))
+	}
+	return nil
+}
+
 // ExecuteCommand executes a command on the remote host
 func (p *ProcessClient) ExecuteCommand(command string, timeout time.Duration, workingDir string) (*model.ExecuteCommandResponse, error) {
 	var cmd string
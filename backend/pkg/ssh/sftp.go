@@ -283,6 +283,56 @@ func (c *SFTPClient) GetFileInfo(path string) (*model.FileInfo, error) {
 	}, nil
 }
 
+// Chmod changes the permissions of a remote file
+func (c *SFTPClient) Chmod(path string, mode os.FileMode) error {
+	if err := c.sftp.Chmod(path, mode); err != nil {
+		return fmt.Errorf("failed to set file permissions: %w", err)
+	}
+	return nil
+}
+
+// Chown changes the owner (and optionally group) of a remote file by name
+func (c *SFTPClient) Chown(path, owner, group string) error {
+	spec := owner
+	if group != "" {
+		spec = owner + ":" + group
+	}
+
+	if _, err := c.run(fmt.Sprintf("chown %s %s", ShellQuote(spec), ShellQuote(path))); err != nil {
+		return fmt.Errorf("failed to change file owner: %w", err)
+	}
+	return nil
+}
+
+// Checksum returns the SHA-256 checksum of a remote file
+func (c *SFTPClient) Checksum(path string) (string, error) {
+	output, err := c.run(fmt.Sprintf("sha256sum %s", ShellQuote(path)))
+	if err != nil {
+		return "", fmt.Errorf("failed to compute checksum: %w", err)
+	}
+
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty checksum output")
+	}
+	return fields[0], nil
+}
+
+// run executes a command on the underlying SSH connection
+func (c *SFTPClient) run(cmd string) (string, error) {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	output, err := session.CombinedOutput(cmd)
+	if err != nil {
+		return string(output), fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
 // Close closes the SFTP and SSH client
 func (c *SFTPClient) Close() error {
 	sftpErr := c.sftp.Close()
@@ -318,3 +368,8 @@ func ValidatePath(path string) (string, error) {
 
 	return path, nil
 }
+
+// ShellQuote quotes a string for safe use as a single POSIX shell argument
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
@@ -4,6 +4,7 @@ import { ConfigProvider } from 'antd'
 import { LoginPage } from './pages/LoginPage'
 import { RegisterPage } from './pages/RegisterPage'
 import { PrivateRoute } from './components/PrivateRoute'
+import { GlobalSearch } from './components/GlobalSearch'
 import HostListPage from './pages/HostListPage'
 import HostDetailPage from './pages/HostDetailPage'
 import SSHTerminalPage from './pages/SSHTerminalPage'
@@ -28,6 +29,11 @@ import PerformanceDashboardPage from './pages/PerformanceDashboardPage'
 import NotificationCenterPage from './pages/NotificationCenterPage'
 import UserManagementPage from './pages/UserManagementPage'
 import { RolesPage } from './pages/RolesPage'
+import { TopologyPage } from './pages/TopologyPage'
+import { SLOPage } from './pages/SLOPage'
+import { SyntheticChecksPage } from './pages/SyntheticChecksPage'
+import { CertificatesPage } from './pages/CertificatesPage'
+import { NetworkDiagnosticsPage } from './pages/NetworkDiagnosticsPage'
 
 // Dashboard placeholder component
 function Dashboard() {
@@ -59,7 +65,10 @@ function Layout() {
         }}
       >
         <h2 style={{ margin: 0 }}>MyOps AIOps Platform</h2>
-        <button onClick={logout}>退出登录</button>
+        <div style={{ display: 'flex', alignItems: 'center', gap: 16 }}>
+          <GlobalSearch />
+          <button onClick={logout}>退出登录</button>
+        </div>
       </header>
       <Routes>
         <Route path="/" element={<Dashboard />} />
@@ -70,6 +79,7 @@ function Layout() {
         <Route path="/clusters/:id/monitoring" element={<ClusterMonitoringPage />} />
         <Route path="/clusters/:id/workloads" element={<WorkloadListPage />} />
         <Route path="/clusters/:id/namespaces/:namespace/pods/:podName" element={<PodDetailPage />} />
+        <Route path="/topology" element={<TopologyPage />} />
         <Route path="/helm/repositories" element={<HelmRepositoryPage />} />
         <Route path="/helm/applications" element={<HelmApplicationPage />} />
         <Route path="/otel/collectors" element={<OtelCollectorPage />} />
@@ -78,6 +88,10 @@ function Layout() {
         <Route path="/grafana/instances" element={<GrafanaInstancesPage />} />
         <Route path="/ai/anomaly-detection" element={<AnomalyDetectionPage />} />
         <Route path="/alerts" element={<AlertListPage />} />
+        <Route path="/slos" element={<SLOPage />} />
+        <Route path="/synthetics" element={<SyntheticChecksPage />} />
+        <Route path="/certificates" element={<CertificatesPage />} />
+        <Route path="/diagnostics" element={<NetworkDiagnosticsPage />} />
         <Route path="/audit-logs" element={<AuditLogPage />} />
         <Route path="/performance" element={<PerformanceDashboardPage />} />
         <Route path="/notifications" element={<NotificationCenterPage />} />
@@ -0,0 +1,66 @@
+// Dashboard annotation API client
+import { apiClient } from './client'
+import type {
+  Annotation,
+  AnnotationWebhook,
+  CreateAnnotationRequest,
+  CreateAnnotationWebhookRequest,
+  ListAnnotationsParams,
+  ListAnnotationsResponse,
+  UpdateAnnotationRequest,
+} from '../types/annotation'
+
+export const annotationApi = {
+  create: async (request: CreateAnnotationRequest): Promise<Annotation> => {
+    const response = await apiClient.post<{ data: Annotation }>('/api/v1/annotations', request)
+    return response.data.data
+  },
+
+  // List annotations, newest first; tags match annotations with any of them
+  list: async (params?: ListAnnotationsParams): Promise<ListAnnotationsResponse> => {
+    const response = await apiClient.get<{ data: ListAnnotationsResponse }>('/api/v1/annotations', {
+      params,
+      paramsSerializer: { indexes: null },
+    })
+    return response.data.data
+  },
+
+  get: async (id: string): Promise<Annotation> => {
+    const response = await apiClient.get<{ data: Annotation }>(`/api/v1/annotations/${id}`)
+    return response.data.data
+  },
+
+  update: async (id: string, request: UpdateAnnotationRequest): Promise<Annotation> => {
+    const response = await apiClient.put<{ data: Annotation }>(`/api/v1/annotations/${id}`, request)
+    return response.data.data
+  },
+
+  delete: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/annotations/${id}`)
+  },
+
+  listWebhooks: async (): Promise<AnnotationWebhook[]> => {
+    const response = await apiClient.get<{ data: AnnotationWebhook[] }>('/api/v1/annotations/webhooks')
+    return response.data.data
+  },
+
+  // Create a webhook; its token is only returned here
+  createWebhook: async (request: CreateAnnotationWebhookRequest): Promise<AnnotationWebhook> => {
+    const response = await apiClient.post<{ data: AnnotationWebhook }>('/api/v1/annotations/webhooks', request)
+    return response.data.data
+  },
+
+  rotateWebhookToken: async (id: string): Promise<AnnotationWebhook> => {
+    const response = await apiClient.post<{ data: AnnotationWebhook }>(`/api/v1/annotations/webhooks/${id}/token`)
+    return response.data.data
+  },
+
+  deleteWebhook: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/annotations/webhooks/${id}`)
+  },
+}
+
+// annotationInboundUrl is where a deploy pipeline posts annotations, with the
+// webhook's token as a bearer token
+export const annotationInboundUrl = (webhook: AnnotationWebhook): string =>
+  `${apiClient.defaults.baseURL}/api/v1/annotations/inbound/${webhook.id}`
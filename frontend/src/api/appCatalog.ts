@@ -0,0 +1,54 @@
+import { apiClient } from './client'
+import type {
+  AppCatalogEntry,
+  AppInstallation,
+  AppInstallationListParams,
+  InstallAppRequest,
+  UpgradeAppRequest,
+} from '../types/appCatalog'
+
+export const appCatalogApi = {
+  listApps: async (category?: string): Promise<AppCatalogEntry[]> => {
+    const response = await apiClient.get<{ data: { data: AppCatalogEntry[]; total: number } }>('/api/v1/app-catalog/apps', {
+      params: category ? { category } : undefined,
+    })
+    return response.data.data.data
+  },
+
+  getApp: async (id: string): Promise<AppCatalogEntry> => {
+    const response = await apiClient.get<{ data: { data: AppCatalogEntry } }>(`/api/v1/app-catalog/apps/${id}`)
+    return response.data.data.data
+  },
+
+  // Install an app; it is health checked until it settles
+  install: async (appId: string, request: InstallAppRequest): Promise<AppInstallation> => {
+    const response = await apiClient.post<{ data: { data: AppInstallation } }>(`/api/v1/app-catalog/apps/${appId}/install`, request)
+    return response.data.data.data
+  },
+
+  listInstallations: async (params?: AppInstallationListParams): Promise<AppInstallation[]> => {
+    const response = await apiClient.get<{ data: { data: AppInstallation[]; total: number } }>('/api/v1/app-catalog/installations', { params })
+    return response.data.data.data
+  },
+
+  getInstallation: async (id: string): Promise<AppInstallation> => {
+    const response = await apiClient.get<{ data: { data: AppInstallation } }>(`/api/v1/app-catalog/installations/${id}`)
+    return response.data.data.data
+  },
+
+  upgrade: async (id: string, request: UpgradeAppRequest): Promise<AppInstallation> => {
+    const response = await apiClient.post<{ data: { data: AppInstallation } }>(`/api/v1/app-catalog/installations/${id}/upgrade`, request)
+    return response.data.data.data
+  },
+
+  // Run the health checks now
+  check: async (id: string): Promise<AppInstallation> => {
+    const response = await apiClient.post<{ data: { data: AppInstallation } }>(`/api/v1/app-catalog/installations/${id}/check`)
+    return response.data.data.data
+  },
+
+  uninstall: async (id: string): Promise<AppInstallation> => {
+    const response = await apiClient.delete<{ data: { data: AppInstallation } }>(`/api/v1/app-catalog/installations/${id}`)
+    return response.data.data.data
+  },
+}
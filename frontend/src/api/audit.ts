@@ -1,6 +1,8 @@
 // Audit API client
 import axios from 'axios'
 import type {
+  AuditChainVerification,
+  AuditCheckpoint,
   AuditLogsResponse,
   AuditLogSummaryResponse,
 } from '../types/audit'
@@ -48,4 +50,16 @@ export const auditApi = {
     const response = await axios.get(`${API_BASE_URL}/api/v1/audit-logs/resource-activity`, { params })
     return response.data
   },
+
+  // Verify the audit log chain, optionally between two sequences
+  verifyChain: async (params?: { from?: number; to?: number }): Promise<AuditChainVerification> => {
+    const response = await axios.get(`${API_BASE_URL}/api/v1/audit-logs/verify`, { params })
+    return response.data.data
+  },
+
+  // Get the checkpoints of the audit log chain, newest first
+  getCheckpoints: async (limit?: number): Promise<{ data: AuditCheckpoint[]; total: number }> => {
+    const response = await axios.get(`${API_BASE_URL}/api/v1/audit-logs/checkpoints`, { params: { limit } })
+    return response.data.data
+  },
 }
@@ -0,0 +1,17 @@
+import { apiClient } from './client'
+import type { BatchItem, BatchResult, BatchResponse } from '../types/batch'
+
+export const batchApi = {
+  // Run up to 20 GET requests in one round trip; results come back in order
+  run: async (requests: BatchItem[]): Promise<BatchResult[]> => {
+    const response = await apiClient.post<{ data: BatchResponse }>('/api/v1/batch', { requests })
+    return response.data.data.responses
+  },
+
+  // Fetch several paths at once, keyed by name, e.g.
+  // batchApi.getAll({ hosts: '/api/v1/hosts', alerts: '/api/v1/alerts?status=firing' })
+  getAll: async (paths: Record<string, string>): Promise<Record<string, BatchResult>> => {
+    const results = await batchApi.run(Object.entries(paths).map(([id, path]) => ({ id, path })))
+    return Object.fromEntries(results.map((result) => [result.id, result]))
+  },
+}
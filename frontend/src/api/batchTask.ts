@@ -7,6 +7,7 @@ import type {
   ExecuteBatchTaskRequest,
   ListBatchTasksResponse,
 } from '../types/batchTask'
+import type { OperationAccepted } from '../types/operation'
 
 const API_BASE_URL = import.meta.env.VITE_API_BASE_URL || 'http://localhost:8080'
 
@@ -26,10 +27,10 @@ export const batchTaskApi = {
     return response.data.data
   },
 
-  // Execute a batch task
-  executeBatchTask: async (request: ExecuteBatchTaskRequest): Promise<{ message: string; taskId: string }> => {
+  // Execute a batch task; it runs as an operation, polled with operationApi
+  executeBatchTask: async (request: ExecuteBatchTaskRequest): Promise<OperationAccepted> => {
     const token = localStorage.getItem('token')
-    const response = await axios.post<{ message: string; taskId: string }>(
+    const response = await axios.post<{ data: OperationAccepted }>(
       `${API_BASE_URL}/api/v1/batch-tasks/execute`,
       request,
       {
@@ -38,7 +39,7 @@ export const batchTaskApi = {
         },
       }
     )
-    return response.data
+    return response.data.data
   },
 
   // Get batch task details
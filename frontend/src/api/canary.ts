@@ -0,0 +1,34 @@
+import { apiClient } from './client'
+import type { CanaryRollout, CreateCanaryRolloutRequest } from '../types/canary'
+
+export const canaryApi = {
+  listRollouts: async (params?: { clusterId?: string; active?: boolean }): Promise<CanaryRollout[]> => {
+    const response = await apiClient.get<{ data: { data: CanaryRollout[]; total: number } }>('/api/v1/rollouts', { params })
+    return response.data.data.data
+  },
+
+  getRollout: async (id: string): Promise<CanaryRollout> => {
+    const response = await apiClient.get<{ data: { data: CanaryRollout } }>(`/api/v1/rollouts/${id}`)
+    return response.data.data.data
+  },
+
+  createRollout: async (request: CreateCanaryRolloutRequest): Promise<CanaryRollout> => {
+    const response = await apiClient.post<{ data: { data: CanaryRollout } }>('/api/v1/rollouts', request)
+    return response.data.data.data
+  },
+
+  // Move on to the next step, or with full promote the new image at once
+  promote: async (id: string, full = false): Promise<CanaryRollout> => {
+    const response = await apiClient.post<{ data: { data: CanaryRollout } }>(`/api/v1/rollouts/${id}/promote`, { full })
+    return response.data.data.data
+  },
+
+  abort: async (id: string): Promise<CanaryRollout> => {
+    const response = await apiClient.post<{ data: { data: CanaryRollout } }>(`/api/v1/rollouts/${id}/abort`)
+    return response.data.data.data
+  },
+
+  deleteRollout: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/rollouts/${id}`)
+  },
+}
@@ -0,0 +1,46 @@
+import { apiClient } from './client'
+import type {
+  Certificate,
+  CertificateList,
+  CertificateListParams,
+  CreateCertificateRequest,
+  UpdateCertificateRequest,
+} from '../types/certificate'
+
+export const certificateApi = {
+  list: async (params?: CertificateListParams): Promise<CertificateList> => {
+    const response = await apiClient.get<{ data: CertificateList }>('/api/v1/certificates', { params })
+    return response.data.data
+  },
+
+  get: async (id: string): Promise<Certificate> => {
+    const response = await apiClient.get<{ data: Certificate }>(`/api/v1/certificates/${id}`)
+    return response.data.data
+  },
+
+  // Monitor the certificate of a TLS endpoint; it is checked right away
+  create: async (request: CreateCertificateRequest): Promise<Certificate> => {
+    const response = await apiClient.post<{ data: Certificate }>('/api/v1/certificates', request)
+    return response.data.data
+  },
+
+  update: async (id: string, request: UpdateCertificateRequest): Promise<Certificate> => {
+    const response = await apiClient.put<{ data: Certificate }>(`/api/v1/certificates/${id}`, request)
+    return response.data.data
+  },
+
+  // Only endpoint certificates can be deleted; discovered ones are disabled instead
+  delete: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/certificates/${id}`)
+  },
+
+  // Check all endpoints and discover the certificates of all clusters now
+  scan: async (): Promise<void> => {
+    await apiClient.post('/api/v1/certificates/scan')
+  },
+
+  check: async (id: string): Promise<Certificate> => {
+    const response = await apiClient.post<{ data: Certificate }>(`/api/v1/certificates/${id}/check`)
+    return response.data.data
+  },
+}
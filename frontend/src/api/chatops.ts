@@ -0,0 +1,53 @@
+// ChatOps integration API client
+import { apiClient } from './client'
+import type { ChatOpsIntegration, ChatOpsIntegrationRequest, ChatUserLink } from '../types/chatops'
+
+export const chatopsApi = {
+  listIntegrations: async (): Promise<ChatOpsIntegration[]> => {
+    const response = await apiClient.get<{ data: { data: ChatOpsIntegration[]; total: number } }>(
+      '/api/v1/chatops/integrations'
+    )
+    return response.data.data.data
+  },
+
+  createIntegration: async (request: ChatOpsIntegrationRequest): Promise<ChatOpsIntegration> => {
+    const response = await apiClient.post<{ data: ChatOpsIntegration }>('/api/v1/chatops/integrations', request)
+    return response.data.data
+  },
+
+  updateIntegration: async (id: string, request: ChatOpsIntegrationRequest): Promise<ChatOpsIntegration> => {
+    const response = await apiClient.put<{ data: ChatOpsIntegration }>(`/api/v1/chatops/integrations/${id}`, request)
+    return response.data.data
+  },
+
+  deleteIntegration: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/chatops/integrations/${id}`)
+  },
+
+  listIntegrationLinks: async (id: string): Promise<ChatUserLink[]> => {
+    const response = await apiClient.get<{ data: { data: ChatUserLink[]; total: number } }>(
+      `/api/v1/chatops/integrations/${id}/links`
+    )
+    return response.data.data.data
+  },
+
+  // Chat accounts linked to the signed-in user
+  listLinks: async (): Promise<ChatUserLink[]> => {
+    const response = await apiClient.get<{ data: { data: ChatUserLink[]; total: number } }>('/api/v1/chatops/links')
+    return response.data.data.data
+  },
+
+  // Link the chat account that was given the code by the `link` command
+  confirmLink: async (code: string): Promise<ChatUserLink> => {
+    const response = await apiClient.post<{ data: ChatUserLink }>('/api/v1/chatops/links', { code })
+    return response.data.data
+  },
+
+  deleteLink: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/chatops/links/${id}`)
+  },
+}
+
+// chatCommandUrl is where a chat system sends the integration's commands
+export const chatCommandUrl = (integrationId: string): string =>
+  `${apiClient.defaults.baseURL}/api/v1/chatops/inbound/${integrationId}`
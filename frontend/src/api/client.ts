@@ -13,6 +13,16 @@ export const apiClient = axios.create({
   },
 })
 
+// Cookie the gateway issues its CSRF token in, echoed back in a header when
+// the UI is served from the gateway's own site
+const CSRF_COOKIE = 'myops_csrf'
+
+const csrfToken = (): string | undefined =>
+  document.cookie
+    .split('; ')
+    .find((cookie) => cookie.startsWith(`${CSRF_COOKIE}=`))
+    ?.slice(CSRF_COOKIE.length + 1)
+
 // Request interceptor - add auth token
 apiClient.interceptors.request.use(
   (config: InternalAxiosRequestConfig) => {
@@ -20,6 +30,10 @@ apiClient.interceptors.request.use(
     if (token && config.headers) {
       config.headers.Authorization = `Bearer ${token}`
     }
+    const csrf = csrfToken()
+    if (csrf && config.headers) {
+      config.headers['X-CSRF-Token'] = csrf
+    }
     return config
   },
   (error: AxiosError) => {
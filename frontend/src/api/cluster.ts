@@ -1,5 +1,6 @@
 // Kubernetes cluster API client
 import axios from 'axios'
+import type { OperationAccepted } from '../types/operation'
 import type {
   K8sCluster,
   ClusterNode,
@@ -9,6 +10,11 @@ import type {
   ClusterConnectionTestRequest,
   ClusterConnectionTestResponse,
   ListClustersResponse,
+  IssueKubeconfigRequest,
+  ClusterUpgradeAssessment,
+  DrainNodeRequest,
+  DrainNodeResult,
+  ScopedKubeconfig,
 } from '../types/cluster'
 
 const API_BASE_URL = import.meta.env.VITE_API_BASE_URL || 'http://localhost:8080'
@@ -19,6 +25,7 @@ export const clusterApi = {
     status?: string
     type?: string
     provider?: string
+    tags?: string // Selector over the clusters' tags, e.g. env=prod
     page?: number
     pageSize?: number
   }): Promise<ListClustersResponse> => {
@@ -135,4 +142,107 @@ export const clusterApi = {
     )
     return response.data.data
   },
+
+  // Issue a time-limited kubeconfig scoped to the user's permissions
+  issueKubeconfig: async (clusterId: string, request: IssueKubeconfigRequest): Promise<ScopedKubeconfig> => {
+    const token = localStorage.getItem('token')
+    const response = await axios.post<{ data: ScopedKubeconfig }>(
+      `${API_BASE_URL}/api/v1/clusters/${clusterId}/kubeconfig`,
+      request,
+      {
+        headers: {
+          Authorization: `Bearer ${token}`,
+        },
+      }
+    )
+    return response.data.data
+  },
+
+  // Revoke the user's kubeconfigs for the cluster, or one namespace of it
+  revokeKubeconfig: async (clusterId: string, namespace?: string): Promise<{ message: string }> => {
+    const token = localStorage.getItem('token')
+    const response = await axios.delete<{ data: { message: string } }>(
+      `${API_BASE_URL}/api/v1/clusters/${clusterId}/kubeconfig`,
+      {
+        params: namespace ? { namespace } : undefined,
+        headers: {
+          Authorization: `Bearer ${token}`,
+        },
+      }
+    )
+    return response.data.data
+  },
+
+  // Mark a node unschedulable, or schedulable again
+  setNodeCordoned: async (clusterId: string, node: string, cordoned: boolean): Promise<{ message: string }> => {
+    const token = localStorage.getItem('token')
+    const response = await axios.post<{ data: { message: string } }>(
+      `${API_BASE_URL}/api/v1/clusters/${clusterId}/nodes/${encodeURIComponent(node)}/${cordoned ? 'cordon' : 'uncordon'}`,
+      undefined,
+      {
+        headers: {
+          Authorization: `Bearer ${token}`,
+        },
+      }
+    )
+    return response.data.data
+  },
+
+  // Start draining a node; poll the returned operation for its progress
+  drainNode: async (clusterId: string, node: string, request: DrainNodeRequest): Promise<OperationAccepted<DrainNodeResult>> => {
+    const token = localStorage.getItem('token')
+    const response = await axios.post<{ data: OperationAccepted<DrainNodeResult> }>(
+      `${API_BASE_URL}/api/v1/clusters/${clusterId}/nodes/${encodeURIComponent(node)}/drain`,
+      request,
+      {
+        headers: {
+          Authorization: `Bearer ${token}`,
+        },
+      }
+    )
+    return response.data.data
+  },
+
+  // Queue a deprecated API assessment for an upgrade, to the next minor release by default
+  runUpgradeAssessment: async (clusterId: string, targetVersion?: string): Promise<ClusterUpgradeAssessment> => {
+    const token = localStorage.getItem('token')
+    const response = await axios.post<{ data: { data: ClusterUpgradeAssessment } }>(
+      `${API_BASE_URL}/api/v1/clusters/${clusterId}/upgrade-assessments`,
+      { targetVersion },
+      {
+        headers: {
+          Authorization: `Bearer ${token}`,
+        },
+      }
+    )
+    return response.data.data.data
+  },
+
+  // List the cluster's upgrade assessments, newest first
+  listUpgradeAssessments: async (clusterId: string): Promise<ClusterUpgradeAssessment[]> => {
+    const token = localStorage.getItem('token')
+    const response = await axios.get<{ data: { data: ClusterUpgradeAssessment[]; total: number } }>(
+      `${API_BASE_URL}/api/v1/clusters/${clusterId}/upgrade-assessments`,
+      {
+        headers: {
+          Authorization: `Bearer ${token}`,
+        },
+      }
+    )
+    return response.data.data.data
+  },
+
+  // Get an upgrade assessment with its findings, or the latest one
+  getUpgradeAssessment: async (clusterId: string, assessmentId: string | 'latest'): Promise<ClusterUpgradeAssessment> => {
+    const token = localStorage.getItem('token')
+    const response = await axios.get<{ data: { data: ClusterUpgradeAssessment } }>(
+      `${API_BASE_URL}/api/v1/clusters/${clusterId}/upgrade-assessments/${assessmentId}`,
+      {
+        headers: {
+          Authorization: `Bearer ${token}`,
+        },
+      }
+    )
+    return response.data.data.data
+  },
 }
@@ -0,0 +1,31 @@
+// Raw data export API client
+import { apiClient } from './client'
+import type { CreateDataExportRequest, DataExport, ListDataExportsResponse } from '../types/dataExport'
+
+export const dataExportApi = {
+  // Queue an export; it is pending until generated
+  create: async (request: CreateDataExportRequest): Promise<DataExport> => {
+    const response = await apiClient.post<{ data: DataExport }>('/api/v1/data-exports', request)
+    return response.data.data
+  },
+
+  list: async (params?: { page?: number; pageSize?: number }): Promise<ListDataExportsResponse> => {
+    const response = await apiClient.get<{ data: ListDataExportsResponse }>('/api/v1/data-exports', { params })
+    return response.data.data
+  },
+
+  // Get an export with a fresh download link once it is generated
+  get: async (id: string): Promise<DataExport> => {
+    const response = await apiClient.get<{ data: DataExport }>(`/api/v1/data-exports/${id}`)
+    return response.data.data
+  },
+
+  delete: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/data-exports/${id}`)
+  },
+}
+
+// dataExportDownloadUrl is the absolute signed link of a generated export,
+// usable without signing in until it expires
+export const dataExportDownloadUrl = (exportItem: DataExport): string | undefined =>
+  exportItem.downloadUrl && `${apiClient.defaults.baseURL}${exportItem.downloadUrl}`
@@ -0,0 +1,29 @@
+import { apiClient } from './client'
+
+export interface RouteLatency {
+  route: string
+  requests: number
+  p95Ms: number
+  p99Ms: number
+  p95ThresholdMs: number
+  p99ThresholdMs: number
+  breached: boolean
+  breachedSince?: string
+}
+
+export const diagnosticsApi = {
+  // Assemble a sanitized tar.gz of the gateway's version, configuration, recent
+  // errors, schema, job queue, inventory, health and route latency for support
+  downloadBundle: async (): Promise<Blob> => {
+    const response = await apiClient.post('/api/v1/admin/diagnostics', undefined, {
+      responseType: 'blob',
+    })
+    return response.data
+  },
+
+  // p95 and p99 of the routes the gateway served recently against their SLOs
+  getRouteLatency: async (): Promise<RouteLatency[]> => {
+    const response = await apiClient.get<{ data: { routes: RouteLatency[] } }>('/api/v1/health/latency')
+    return response.data.data.routes
+  },
+}
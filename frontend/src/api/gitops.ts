@@ -0,0 +1,56 @@
+import { apiClient } from './client'
+import type {
+  CreateGitOpsSourceRequest,
+  GitOpsSource,
+  GitOpsSync,
+  SyncGitOpsSourceRequest,
+  UpdateGitOpsSourceRequest,
+} from '../types/gitops'
+
+export const gitopsApi = {
+  listSources: async (clusterId?: string): Promise<GitOpsSource[]> => {
+    const response = await apiClient.get<{ data: { data: GitOpsSource[]; total: number } }>('/api/v1/gitops/sources', {
+      params: clusterId ? { clusterId } : undefined,
+    })
+    return response.data.data.data
+  },
+
+  getSource: async (id: string): Promise<GitOpsSource> => {
+    const response = await apiClient.get<{ data: { data: GitOpsSource } }>(`/api/v1/gitops/sources/${id}`)
+    return response.data.data.data
+  },
+
+  // Add a source; it is checked, and synced when it auto-syncs, within a minute
+  createSource: async (request: CreateGitOpsSourceRequest): Promise<GitOpsSource> => {
+    const response = await apiClient.post<{ data: { data: GitOpsSource } }>('/api/v1/gitops/sources', request)
+    return response.data.data.data
+  },
+
+  updateSource: async (id: string, request: UpdateGitOpsSourceRequest): Promise<GitOpsSource> => {
+    const response = await apiClient.put<{ data: { data: GitOpsSource } }>(`/api/v1/gitops/sources/${id}`, request)
+    return response.data.data.data
+  },
+
+  // Delete a source; with prune the objects it manages are deleted from the cluster too
+  deleteSource: async (id: string, prune = false): Promise<void> => {
+    await apiClient.delete(`/api/v1/gitops/sources/${id}`, { params: prune ? { prune: true } : undefined })
+  },
+
+  sync: async (id: string, request: SyncGitOpsSourceRequest = {}): Promise<GitOpsSync> => {
+    const response = await apiClient.post<{ data: { data: GitOpsSync } }>(`/api/v1/gitops/sources/${id}/sync`, request)
+    return response.data.data.data
+  },
+
+  // Re-apply the commit of an earlier successful sync; auto-sync is turned off
+  rollback: async (id: string, syncId: string): Promise<GitOpsSync> => {
+    const response = await apiClient.post<{ data: { data: GitOpsSync } }>(`/api/v1/gitops/sources/${id}/rollback`, { syncId })
+    return response.data.data.data
+  },
+
+  listSyncs: async (id: string, limit?: number): Promise<GitOpsSync[]> => {
+    const response = await apiClient.get<{ data: { data: GitOpsSync[]; total: number } }>(`/api/v1/gitops/sources/${id}/syncs`, {
+      params: limit ? { limit } : undefined,
+    })
+    return response.data.data.data
+  },
+}
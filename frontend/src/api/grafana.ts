@@ -1,4 +1,5 @@
 import axios from 'axios'
+import type { OperationAccepted } from '../types/operation'
 
 const API_BASE_URL = import.meta.env.VITE_API_BASE_URL || 'http://localhost:8080'
 
@@ -238,9 +239,10 @@ const grafanaApi = {
     return response.data
   },
 
-  // Sync an instance
+  // Sync an instance; the sync runs as an operation whose result is the
+  // SyncGrafanaInstanceResponse
   syncInstance: async (id: string, data: SyncGrafanaInstanceRequest) => {
-    const response = await axios.post<SyncGrafanaInstanceResponse>(
+    const response = await axios.post<{ data: OperationAccepted<SyncGrafanaInstanceResponse> }>(
       `${API_BASE_URL}/api/v1/grafana/instances/${id}/sync`,
       data,
       {
@@ -249,7 +251,7 @@ const grafanaApi = {
         },
       }
     )
-    return response.data
+    return response.data.data
   },
 
   // ============== Dashboard Management ==============
@@ -0,0 +1,20 @@
+import { apiClient } from './client'
+
+export interface GraphQLError {
+  message: string
+  path?: (string | number)[]
+}
+
+export interface GraphQLResponse<T> {
+  data?: T
+  errors?: GraphQLError[]
+}
+
+export const graphqlApi = {
+  // Run a read-only query against /api/v1/graphql. Fields that failed come back
+  // as null next to the errors, so callers can show what did resolve.
+  query: async <T>(query: string, variables?: Record<string, unknown>): Promise<GraphQLResponse<T>> => {
+    const response = await apiClient.post<GraphQLResponse<T>>('/api/v1/graphql', { query, variables })
+    return response.data
+  },
+}
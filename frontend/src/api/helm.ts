@@ -71,6 +71,59 @@ export interface HelmRepoListResponse {
   totalPages: number
 }
 
+export interface HelmReleaseHistory {
+  revision: number
+  updated: string
+  status: string
+  chart: string
+  chartVersion: string
+  appVersion: string
+  description: string
+}
+
+// Data of the helm.release_installed, helm.release_upgraded and
+// helm.release_rolled_back events; lists the values keys that changed, not their values
+export interface HelmReleaseChange {
+  action: 'install' | 'upgrade' | 'rollback'
+  releaseId: string
+  clusterId: string
+  namespace: string
+  name: string
+  chart: string
+  fromRevision?: number
+  revision: number
+  fromChartVersion?: string
+  chartVersion: string
+  changedValues: string[]
+  changedValuesCut?: boolean
+  changedBy?: string
+}
+
+export interface HelmManifestChange {
+  action: 'added' | 'changed' | 'removed'
+  apiVersion: string
+  kind: string
+  namespace?: string
+  name: string
+  diff: string
+}
+
+export interface HelmReleasePreview {
+  releaseId: string
+  revision: number
+  chart: string
+  fromChartVersion: string
+  chartVersion: string
+  valid: boolean
+  schemaErrors: string[]
+  renderError?: string
+  changedValues: string[]
+  baseline: 'cluster' | 'revision' | 'none'
+  changes: HelmManifestChange[]
+  unchanged: number
+  warnings: string[]
+}
+
 const helmApi = {
   // List all Helm repositories
   getRepositories: async (params?: { status?: string; type?: string; page?: number; pageSize?: number }) => {
@@ -179,6 +232,7 @@ const helmApi = {
     chartVersion?: string
     values?: string
     description?: string
+    notify?: boolean
   }) => {
     const response = await axios.post<{ message: string; release: any }>(`${API_BASE_URL}/api/v1/helm/releases`, data, {
       headers: {
@@ -189,8 +243,8 @@ const helmApi = {
   },
 
   // Upgrade a Helm release
-  upgradeRelease: async (id: string, data: { chartVersion?: string; values?: string }) => {
-    const response = await axios.post<{ message: string }>(`${API_BASE_URL}/api/v1/helm/releases/${id}/upgrade`, data, {
+  upgradeRelease: async (id: string, data: { chartVersion?: string; values?: string; notify?: boolean }) => {
+    const response = await axios.post<{ message: string; release: any }>(`${API_BASE_URL}/api/v1/helm/releases/${id}/upgrade`, data, {
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
       },
@@ -198,9 +252,19 @@ const helmApi = {
     return response.data
   },
 
+  // Preview the changes of upgrading a Helm release
+  previewRelease: async (id: string, data: { chartVersion?: string; values?: string }) => {
+    const response = await axios.post<{ data: { preview: HelmReleasePreview } }>(`${API_BASE_URL}/api/v1/helm/releases/${id}/preview`, data, {
+      headers: {
+        Authorization: `Bearer ${localStorage.getItem('token')}`,
+      },
+    })
+    return response.data.data
+  },
+
   // Rollback a Helm release
-  rollbackRelease: async (id: string, data: { revision: number }) => {
-    const response = await axios.post<{ message: string }>(`${API_BASE_URL}/api/v1/helm/releases/${id}/rollback`, data, {
+  rollbackRelease: async (id: string, data: { revision?: number; notify?: boolean }) => {
+    const response = await axios.post<{ message: string; release: any }>(`${API_BASE_URL}/api/v1/helm/releases/${id}/rollback`, data, {
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
       },
@@ -220,7 +284,7 @@ const helmApi = {
 
   // Get Helm release history
   getReleaseHistory: async (id: string) => {
-    const response = await axios.get<{ history: any[] }>(`${API_BASE_URL}/api/v1/helm/releases/${id}/history`, {
+    const response = await axios.get<{ history: HelmReleaseHistory[] }>(`${API_BASE_URL}/api/v1/helm/releases/${id}/history`, {
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
       },
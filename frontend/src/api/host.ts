@@ -6,6 +6,17 @@ import type {
   HostListParams,
   HostListResponse,
   RejectHostRequest,
+  HostBulkAction,
+  HostBulkRequest,
+  HostBulkResult,
+  HostBulkApproval,
+  HostBulkApprovalStatus,
+  HostBulkApprovalList,
+  HostLifecycleInfo,
+  HostLifecycleRequest,
+  HostAgentToken,
+  HostArchive,
+  HostArchiveList,
 } from '../types/host'
 
 export const hostApi = {
@@ -16,8 +27,13 @@ export const hostApi = {
     if (params.page) queryParams.append('page', String(params.page))
     if (params.pageSize) queryParams.append('page_size', String(params.pageSize))
     if (params.status) queryParams.append('status', params.status)
+    if (params.lifecycle) {
+      const lifecycle = Array.isArray(params.lifecycle) ? params.lifecycle.join(',') : params.lifecycle
+      if (lifecycle) queryParams.append('lifecycle', lifecycle)
+    }
     if (params.hostname) queryParams.append('hostname', params.hostname)
     if (params.ipAddress) queryParams.append('ip_address', params.ipAddress)
+    if (params.group !== undefined) queryParams.append('group', params.group)
     if (params.registeredBy) queryParams.append('registered_by', params.registeredBy)
     if (params.sortBy) queryParams.append('sort_by', params.sortBy)
     if (params.sortDesc !== undefined) queryParams.append('sort_desc', String(params.sortDesc))
@@ -60,4 +76,65 @@ export const hostApi = {
     const response = await apiClient.patch<{ data: Host }>(`/api/v1/hosts/${id}/reject`, data)
     return response.data.data
   },
+
+  // Apply tags, labels, agent_config or move to many hosts, host by host
+  bulkApply: async (action: Exclude<HostBulkAction, 'delete' | 'retire'>, data: HostBulkRequest): Promise<HostBulkResult> => {
+    const response = await apiClient.post<{ data: HostBulkResult }>(`/api/v1/hosts/bulk/${action}`, data)
+    return response.data.data
+  },
+
+  // Request the deletion or decommissioning of many hosts, applied once another user approves it
+  bulkRequestApproval: async (action: 'delete' | 'retire', data: HostBulkRequest): Promise<HostBulkApproval> => {
+    const response = await apiClient.post<{ data: HostBulkApproval }>(`/api/v1/hosts/bulk/${action}`, data)
+    return response.data.data
+  },
+
+  listBulkApprovals: async (params: { status?: HostBulkApprovalStatus; page?: number; pageSize?: number } = {}): Promise<HostBulkApprovalList> => {
+    const response = await apiClient.get<{ data: HostBulkApprovalList }>('/api/v1/hosts/bulk/approvals', { params })
+    return response.data.data
+  },
+
+  getBulkApproval: async (id: string): Promise<HostBulkApproval> => {
+    const response = await apiClient.get<{ data: HostBulkApproval }>(`/api/v1/hosts/bulk/approvals/${id}`)
+    return response.data.data
+  },
+
+  // Approve and apply a pending bulk action; the result is on the approval
+  approveBulkAction: async (id: string, comment?: string): Promise<HostBulkApproval> => {
+    const response = await apiClient.post<{ data: HostBulkApproval }>(`/api/v1/hosts/bulk/approvals/${id}/approve`, { comment })
+    return response.data.data
+  },
+
+  // Reject a pending bulk action, or withdraw one's own
+  rejectBulkAction: async (id: string, comment?: string): Promise<HostBulkApproval> => {
+    const response = await apiClient.post<{ data: HostBulkApproval }>(`/api/v1/hosts/bulk/approvals/${id}/reject`, { comment })
+    return response.data.data
+  },
+
+  getLifecycle: async (id: string): Promise<HostLifecycleInfo> => {
+    const response = await apiClient.get<{ data: HostLifecycleInfo }>(`/api/v1/hosts/${id}/lifecycle`)
+    return response.data.data
+  },
+
+  // Move a host to another lifecycle state; decommissioning revokes its agent token and archives its history
+  setLifecycle: async (id: string, data: HostLifecycleRequest): Promise<Host> => {
+    const response = await apiClient.put<{ data: Host }>(`/api/v1/hosts/${id}/lifecycle`, data)
+    return response.data.data
+  },
+
+  // Issue a new agent token for a host, replacing the previous one. It is only returned here.
+  issueAgentToken: async (id: string): Promise<HostAgentToken> => {
+    const response = await apiClient.post<{ data: HostAgentToken }>(`/api/v1/hosts/${id}/agent-token`)
+    return response.data.data
+  },
+
+  listArchives: async (params: { page?: number; pageSize?: number } = {}): Promise<HostArchiveList> => {
+    const response = await apiClient.get<{ data: HostArchiveList }>('/api/v1/host-archives', { params })
+    return response.data.data
+  },
+
+  getArchive: async (hostId: string): Promise<HostArchive> => {
+    const response = await apiClient.get<{ data: HostArchive }>(`/api/v1/host-archives/${hostId}`)
+    return response.data.data
+  },
 }
@@ -0,0 +1,38 @@
+import { apiClient } from './client'
+import type { Job, JobTypeStats, ListJobsParams, ListJobsResponse } from '../types/job'
+
+export const jobApi = {
+  list: async (params?: ListJobsParams): Promise<ListJobsResponse> => {
+    const response = await apiClient.get<{ data: ListJobsResponse }>('/api/v1/jobs', { params })
+    return response.data.data
+  },
+
+  // Jobs out of attempts, kept until requeued or deleted
+  listDead: async (params?: Omit<ListJobsParams, 'status'>): Promise<ListJobsResponse> =>
+    jobApi.list({ ...params, status: 'dead' }),
+
+  stats: async (): Promise<JobTypeStats[]> => {
+    const response = await apiClient.get<{ data: { data: JobTypeStats[] } }>('/api/v1/jobs/stats')
+    return response.data.data.data
+  },
+
+  get: async (id: string): Promise<Job> => {
+    const response = await apiClient.get<{ data: Job }>(`/api/v1/jobs/${id}`)
+    return response.data.data
+  },
+
+  requeue: async (id: string): Promise<Job> => {
+    const response = await apiClient.post<{ data: Job }>(`/api/v1/jobs/${id}/requeue`)
+    return response.data.data
+  },
+
+  // Requeue the dead jobs of a type, or all of them
+  requeueDead: async (type?: string): Promise<number> => {
+    const response = await apiClient.post<{ data: { requeued: number } }>('/api/v1/jobs/requeue', { type })
+    return response.data.data.requeued
+  },
+
+  delete: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/jobs/${id}`)
+  },
+}
@@ -0,0 +1,31 @@
+import { apiClient } from './client'
+import type { OperationAccepted } from '../types/operation'
+import type {
+  NetworkDiagnostic,
+  NetworkDiagnosticList,
+  NetworkDiagnosticListParams,
+  RunNetworkDiagnosticRequest,
+} from '../types/networkDiagnostic'
+
+export const networkDiagnosticApi = {
+  // Results are left out of the list; get a diagnostic to see its result
+  list: async (params?: NetworkDiagnosticListParams): Promise<NetworkDiagnosticList> => {
+    const response = await apiClient.get<{ data: NetworkDiagnosticList }>('/api/v1/diagnostics', { params })
+    return response.data.data
+  },
+
+  get: async (id: string): Promise<NetworkDiagnostic> => {
+    const response = await apiClient.get<{ data: NetworkDiagnostic }>(`/api/v1/diagnostics/${id}`)
+    return response.data.data
+  },
+
+  // Start a test from the host's agent; the operation's result is the finished diagnostic
+  run: async (request: RunNetworkDiagnosticRequest): Promise<OperationAccepted<NetworkDiagnostic>> => {
+    const response = await apiClient.post<{ data: OperationAccepted<NetworkDiagnostic> }>('/api/v1/diagnostics', request)
+    return response.data.data
+  },
+
+  delete: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/diagnostics/${id}`)
+  },
+}
@@ -6,6 +6,10 @@ import type {
   UnreadCountResponse,
   NotificationStatsResponse,
   NotificationPreferenceResponse,
+  NotificationDigestPreviewResponse,
+  NotificationAction,
+  NotificationPageResponse,
+  NotificationSearchParams,
 } from '../types/notification'
 
 const API_BASE_URL = import.meta.env.VITE_API_BASE_URL || 'http://localhost:8080'
@@ -20,6 +24,35 @@ export const notificationApi = {
     return response.data
   },
 
+  // Search notifications a page at a time, for infinite scroll
+  searchNotifications: async (params: NotificationSearchParams = {}): Promise<NotificationPageResponse> => {
+    const queryParams = new URLSearchParams()
+
+    if (params.q) queryParams.append('q', params.q)
+    if (params.sources?.length) queryParams.append('sources', params.sources.join(','))
+    if (params.types?.length) queryParams.append('types', params.types.join(','))
+    if (params.priorities?.length) queryParams.append('priorities', params.priorities.join(','))
+    if (params.read !== undefined) queryParams.append('read', String(params.read))
+    if (params.archived) queryParams.append('archived', 'true')
+    if (params.cursor) queryParams.append('cursor', params.cursor)
+    if (params.limit) queryParams.append('limit', String(params.limit))
+
+    const response = await axios.get<NotificationPageResponse>(
+      `${API_BASE_URL}/api/v1/notifications/search?${queryParams.toString()}`
+    )
+    return response.data
+  },
+
+  // Mark read or unread, archive, restore or delete several notifications
+  bulkUpdate: async (action: NotificationAction, ids: string[]): Promise<{ data: { affected: number } }> => {
+    const response = await axios.post(`${API_BASE_URL}/api/v1/notifications/bulk`, { action, ids })
+    return response.data
+  },
+
+  // URL of the event stream carrying notification deliveries and read state changes
+  changesUrl: (): string =>
+    `${API_BASE_URL.replace('http', 'ws')}/api/v1/events/ws?types=notification.delivered,notification.updated`,
+
   // Get unread count
   getUnreadCount: async (): Promise<UnreadCountResponse> => {
     const response = await axios.get<UnreadCountResponse>(`${API_BASE_URL}/api/v1/notifications/unread-count`)
@@ -56,6 +89,12 @@ export const notificationApi = {
     return response.data
   },
 
+  // Preview what the preference would digest among recent notifications
+  previewNotificationPreference: async (pref: Partial<NotificationPreference>): Promise<NotificationDigestPreviewResponse> => {
+    const response = await axios.post<NotificationDigestPreviewResponse>(`${API_BASE_URL}/api/v1/notifications/preferences/preview`, pref)
+    return response.data
+  },
+
   // Get notification stats
   getNotificationStats: async (): Promise<NotificationStatsResponse> => {
     const response = await axios.get<NotificationStatsResponse>(`${API_BASE_URL}/api/v1/notifications/stats`)
@@ -0,0 +1,39 @@
+import { apiClient } from './client'
+import type { ListOperationsParams, ListOperationsResponse, Operation } from '../types/operation'
+
+const isDone = (operation: Operation) =>
+  operation.status === 'succeeded' || operation.status === 'failed' || operation.status === 'cancelled'
+
+export const operationApi = {
+  get: async <T = unknown>(id: string): Promise<Operation<T>> => {
+    const response = await apiClient.get<{ data: Operation<T> }>(`/api/v1/operations/${id}`)
+    return response.data.data
+  },
+
+  list: async (params?: ListOperationsParams): Promise<ListOperationsResponse> => {
+    const response = await apiClient.get<{ data: ListOperationsResponse }>('/api/v1/operations', { params })
+    return response.data.data
+  },
+
+  // Ask an operation to stop; it reports cancelled once its work has stopped
+  cancel: async (id: string): Promise<Operation> => {
+    const response = await apiClient.post<{ data: Operation }>(`/api/v1/operations/${id}/cancel`)
+    return response.data.data
+  },
+
+  // Poll an operation until it is done, calling onProgress with each poll
+  wait: async <T = unknown>(
+    id: string,
+    options: { interval?: number; onProgress?: (operation: Operation<T>) => void } = {}
+  ): Promise<Operation<T>> => {
+    const interval = options.interval ?? 1000
+    for (;;) {
+      const operation = await operationApi.get<T>(id)
+      options.onProgress?.(operation)
+      if (isDone(operation)) {
+        return operation
+      }
+      await new Promise((resolve) => setTimeout(resolve, interval))
+    }
+  },
+}
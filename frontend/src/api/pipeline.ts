@@ -0,0 +1,57 @@
+import { apiClient } from './client'
+import type {
+  CreateDeploymentPipelineRequest,
+  DeploymentPipeline,
+  DeploymentPipelineRun,
+  DeploymentPipelineSecret,
+  TriggerDeploymentPipelineRequest,
+  UpdateDeploymentPipelineRequest,
+} from '../types/pipeline'
+
+export const pipelineApi = {
+  listPipelines: async (clusterId?: string): Promise<DeploymentPipeline[]> => {
+    const response = await apiClient.get<{ data: { data: DeploymentPipeline[]; total: number } }>('/api/v1/pipelines', {
+      params: clusterId ? { clusterId } : undefined,
+    })
+    return response.data.data.data
+  },
+
+  getPipeline: async (id: string): Promise<DeploymentPipeline> => {
+    const response = await apiClient.get<{ data: { data: DeploymentPipeline } }>(`/api/v1/pipelines/${id}`)
+    return response.data.data.data
+  },
+
+  // Create a pipeline; CI signs its webhook requests with the secret returned
+  createPipeline: async (request: CreateDeploymentPipelineRequest): Promise<DeploymentPipelineSecret> => {
+    const response = await apiClient.post<{ data: { data: DeploymentPipelineSecret } }>('/api/v1/pipelines', request)
+    return response.data.data.data
+  },
+
+  updatePipeline: async (id: string, request: UpdateDeploymentPipelineRequest): Promise<DeploymentPipeline> => {
+    const response = await apiClient.put<{ data: { data: DeploymentPipeline } }>(`/api/v1/pipelines/${id}`, request)
+    return response.data.data.data
+  },
+
+  deletePipeline: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/pipelines/${id}`)
+  },
+
+  rotateSecret: async (id: string): Promise<DeploymentPipelineSecret> => {
+    const response = await apiClient.post<{ data: { data: DeploymentPipelineSecret } }>(`/api/v1/pipelines/${id}/rotate-secret`)
+    return response.data.data.data
+  },
+
+  // Roll out a tag without CI
+  trigger: async (id: string, request: TriggerDeploymentPipelineRequest): Promise<DeploymentPipelineRun> => {
+    const response = await apiClient.post<{ data: { data: DeploymentPipelineRun } }>(`/api/v1/pipelines/${id}/run`, request)
+    return response.data.data.data
+  },
+
+  listRuns: async (id: string, limit?: number): Promise<DeploymentPipelineRun[]> => {
+    const response = await apiClient.get<{ data: { data: DeploymentPipelineRun[]; total: number } }>(
+      `/api/v1/pipelines/${id}/runs`,
+      { params: limit ? { limit } : undefined }
+    )
+    return response.data.data.data
+  },
+}
@@ -1,7 +1,16 @@
 import axios from 'axios'
+import type { AnnotationKind } from '../types/annotation'
 
 const API_BASE_URL = import.meta.env.VITE_API_BASE_URL || 'http://localhost:8080'
 
+// virtual data sources query their members and label each series with `source`
+export type PrometheusDataSourceFlavor =
+  | 'prometheus'
+  | 'thanos'
+  | 'victoriametrics'
+  | 'mimir'
+  | 'virtual'
+
 export interface PrometheusDataSource {
   id: string
   userId: string
@@ -13,6 +22,10 @@ export interface PrometheusDataSource {
   insecureSkipTLS: boolean
   caCert?: string
   clientCert?: string
+  flavor: PrometheusDataSourceFlavor
+  tenantId?: string
+  partialResponse: boolean
+  memberIds?: string[]
   lastTestAt?: string
   lastTestStatus?: string
   lastTestError?: string
@@ -38,6 +51,10 @@ export interface CreatePrometheusDataSourceRequest {
   clientCert?: string
   clientKey?: string
   headers?: string
+  flavor?: PrometheusDataSourceFlavor
+  tenantId?: string
+  partialResponse?: boolean
+  memberIds?: string[]
 }
 
 export interface UpdatePrometheusDataSourceRequest {
@@ -51,6 +68,10 @@ export interface UpdatePrometheusDataSourceRequest {
   clientKey?: string
   headers?: string
   status?: 'active' | 'inactive' | 'error'
+  flavor?: PrometheusDataSourceFlavor
+  tenantId?: string
+  partialResponse?: boolean
+  memberIds?: string[]
 }
 
 export interface TestPrometheusDataSourceRequest {
@@ -61,14 +82,19 @@ export interface TestPrometheusDataSourceRequest {
   caCert?: string
   clientCert?: string
   clientKey?: string
+  flavor?: PrometheusDataSourceFlavor
+  memberIds?: string[]
 }
 
 export interface TestPrometheusDataSourceResponse {
   success: boolean
+  flavor?: PrometheusDataSourceFlavor
   version?: string
+  application?: string
   message: string
   error?: string
   duration: number
+  members?: Record<string, TestPrometheusDataSourceResponse>
 }
 
 export interface PrometheusAlertRule {
@@ -124,8 +150,37 @@ export interface UpdatePrometheusAlertRuleRequest {
   enabled?: boolean
 }
 
+export interface PrometheusAlertRulePreviewRequest {
+  dataSourceId: string
+  expression: string
+}
+
+export interface PrometheusAlertRulePreview {
+  series: PrometheusSeries[]
+  warnings?: string[]
+  duration: number
+}
+
+// A query built from a common pattern; the server renders the PromQL
+export interface PromQLQuery {
+  kind: 'rate' | 'increase' | 'quantile' | 'average'
+  metric: string // histograms without _bucket, _sum or _count
+  matchers?: PromQLMatcher[]
+  by?: string[]
+  window?: string // $__rate_interval by default
+  quantile?: number // 0 to 1
+  native?: boolean // native histogram
+}
+
+export interface PromQLMatcher {
+  label: string
+  op?: '=' | '!=' | '=~' | '!~'
+  value: string
+}
+
 export interface PrometheusQueryRequest {
-  query: string
+  query: string // built from builder when empty
+  builder?: PromQLQuery
   queryType: 'instant' | 'range'
   startTime?: string
   endTime?: string
@@ -136,6 +191,7 @@ export interface PrometheusQueryResponse {
   status: string
   data?: PrometheusSeries[]
   error?: string
+  warnings?: string[]
   duration: number
 }
 
@@ -143,6 +199,20 @@ export interface PrometheusSeries {
   metric: Record<string, string>
   values?: PrometheusValue[]
   value?: PrometheusValue
+  histograms?: PrometheusHistogram[] // native histograms
+  histogram?: PrometheusHistogram
+}
+
+export interface PrometheusHistogram {
+  timestamp: number
+  count: string
+  sum: string
+  buckets?: {
+    boundaries: 0 | 1 | 2 | 3 // 0 upper inclusive, 1 lower, 2 neither, 3 both
+    lower: string
+    upper: string
+    count: string
+  }[]
 }
 
 export interface PrometheusValue {
@@ -169,6 +239,70 @@ export interface PrometheusDashboard {
   }
 }
 
+// The dashboard config the server renders; other keys are kept for the page
+export type PrometheusDashboardVariableType =
+  | 'query'
+  | 'custom'
+  | 'constant'
+  | 'textbox'
+  | 'interval'
+
+export interface PrometheusDashboardVariable {
+  name: string
+  label?: string
+  type: PrometheusDashboardVariableType
+  // label_values(label), label_values(selector, label), label_names(),
+  // metrics(regex) or query_result(expr)
+  query?: string
+  current: string // '$__all' selects every option
+  options?: string[]
+  multi?: boolean
+  includeAll?: boolean
+  allValue?: string
+  regex?: string
+}
+
+export interface PrometheusDashboardPanel {
+  id: string | number
+  title?: string
+  description?: string
+  type?: string
+  dataSourceId?: string
+  gridPos?: { x: number; y: number; w: number; h: number }
+  targets: {
+    refId?: string
+    expr: string
+    builder?: PromQLQuery
+    legendFormat?: string
+    hide?: boolean
+  }[]
+  repeat?: string
+  repeatDirection?: 'h' | 'v'
+}
+
+export interface PrometheusDashboardConfig {
+  dataSourceId?: string
+  variables?: PrometheusDashboardVariable[]
+  panels: PrometheusDashboardPanel[]
+  // Narrows the annotations renders include; empty lists include everything
+  annotationFilter?: {
+    disabled?: boolean
+    kinds?: AnnotationKind[]
+    tags?: string[]
+  }
+}
+
+export interface PrometheusDashboardVariableResult {
+  name: string
+  label?: string
+  type: PrometheusDashboardVariableType
+  current: string
+  options: string[]
+  multi?: boolean
+  includeAll?: boolean
+  error?: string
+}
+
 export interface CreatePrometheusDashboardRequest {
   clusterId?: string
   name: string
@@ -338,6 +472,20 @@ const prometheusApi = {
     return response.data
   },
 
+  // Evaluate an alert expression before saving the rule
+  previewAlertRule: async (data: PrometheusAlertRulePreviewRequest) => {
+    const response = await axios.post<{ data: PrometheusAlertRulePreview }>(
+      `${API_BASE_URL}/api/v1/prometheus/alert-rules/preview`,
+      data,
+      {
+        headers: {
+          Authorization: `Bearer ${localStorage.getItem('token')}`,
+        },
+      }
+    )
+    return response.data.data
+  },
+
   // Update an alert rule
   updateAlertRule: async (
     id: string,
@@ -384,6 +532,20 @@ const prometheusApi = {
     return response.data
   },
 
+  // Render the PromQL of a built query
+  buildQuery: async (data: PromQLQuery) => {
+    const response = await axios.post<{ expr: string }>(
+      `${API_BASE_URL}/api/v1/prometheus/query-builder`,
+      data,
+      {
+        headers: {
+          Authorization: `Bearer ${localStorage.getItem('token')}`,
+        },
+      }
+    )
+    return response.data
+  },
+
   // ============== Dashboard Management ==============
 
   // List all dashboards
@@ -452,6 +614,29 @@ const prometheusApi = {
     return response.data
   },
 
+  // Resolve the options of a dashboard's template variables; vars overrides
+  // their selections like the var-{name} parameters of the render endpoint
+  getDashboardVariables: async (
+    id: string,
+    params?: { start?: string; end?: string; vars?: Record<string, string | string[]> }
+  ) => {
+    const query = new URLSearchParams()
+    if (params?.start) query.append('start', params.start)
+    if (params?.end) query.append('end', params.end)
+    Object.entries(params?.vars || {}).forEach(([name, value]) => {
+      ;(Array.isArray(value) ? value : [value]).forEach((v) => query.append(`var-${name}`, v))
+    })
+    const response = await axios.get<{ data: PrometheusDashboardVariableResult[] }>(
+      `${API_BASE_URL}/api/v1/prometheus/dashboards/${id}/variables?${query.toString()}`,
+      {
+        headers: {
+          Authorization: `Bearer ${localStorage.getItem('token')}`,
+        },
+      }
+    )
+    return response.data
+  },
+
   // Delete a dashboard
   deleteDashboard: async (id: string) => {
     const response = await axios.delete<{ message: string }>(
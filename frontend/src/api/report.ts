@@ -0,0 +1,78 @@
+import { apiClient } from './client'
+import type {
+  CreateReportScheduleRequest,
+  GenerateReportRequest,
+  ListReportsParams,
+  ListReportsResponse,
+  Report,
+  ReportFormat,
+  ReportSchedule,
+  ReportTemplate,
+  UpdateReportScheduleRequest,
+} from '../types/report'
+
+export const reportApi = {
+  templates: async (): Promise<ReportTemplate[]> => {
+    const response = await apiClient.get<{ data: { data: ReportTemplate[] } }>('/api/v1/reports/templates')
+    return response.data.data.data
+  },
+
+  // Queue a report; it is pending until generated
+  generate: async (request: GenerateReportRequest): Promise<Report> => {
+    const response = await apiClient.post<{ data: Report }>('/api/v1/reports', request)
+    return response.data.data
+  },
+
+  list: async (params?: ListReportsParams): Promise<ListReportsResponse> => {
+    const response = await apiClient.get<{ data: ListReportsResponse }>('/api/v1/reports', { params })
+    return response.data.data
+  },
+
+  get: async (id: string): Promise<Report> => {
+    const response = await apiClient.get<{ data: Report }>(`/api/v1/reports/${id}`)
+    return response.data.data
+  },
+
+  // Download a generated report in its own format unless another is given
+  download: async (id: string, format?: ReportFormat): Promise<Blob> => {
+    const response = await apiClient.get(`/api/v1/reports/${id}/download`, {
+      params: format ? { format } : undefined,
+      responseType: 'blob',
+    })
+    return response.data
+  },
+
+  delete: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/reports/${id}`)
+  },
+
+  listSchedules: async (): Promise<ReportSchedule[]> => {
+    const response = await apiClient.get<{ data: { data: ReportSchedule[] } }>('/api/v1/reports/schedules')
+    return response.data.data.data
+  },
+
+  getSchedule: async (id: string): Promise<ReportSchedule> => {
+    const response = await apiClient.get<{ data: ReportSchedule }>(`/api/v1/reports/schedules/${id}`)
+    return response.data.data
+  },
+
+  createSchedule: async (request: CreateReportScheduleRequest): Promise<ReportSchedule> => {
+    const response = await apiClient.post<{ data: ReportSchedule }>('/api/v1/reports/schedules', request)
+    return response.data.data
+  },
+
+  updateSchedule: async (id: string, request: UpdateReportScheduleRequest): Promise<ReportSchedule> => {
+    const response = await apiClient.put<{ data: ReportSchedule }>(`/api/v1/reports/schedules/${id}`, request)
+    return response.data.data
+  },
+
+  deleteSchedule: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/reports/schedules/${id}`)
+  },
+
+  // Queue a report of a schedule now, without moving its next run
+  runSchedule: async (id: string): Promise<Report> => {
+    const response = await apiClient.post<{ data: Report }>(`/api/v1/reports/schedules/${id}/run`)
+    return response.data.data
+  },
+}
@@ -0,0 +1,45 @@
+// Runbook API client
+import { apiClient } from './client'
+import type { Runbook, RunbookExecution, RunbookExecutionsResponse } from '../types/runbook'
+
+export const runbookApi = {
+  // List the runbooks of an alert rule
+  listRunbooks: async (ruleId: string): Promise<Runbook[]> => {
+    const response = await apiClient.get<{ data: { data: Runbook[]; total: number } }>(`/api/v1/alert-rules/${ruleId}/runbooks`)
+    return response.data.data.data
+  },
+
+  // Attach a runbook to an alert rule
+  createRunbook: async (ruleId: string, runbook: Partial<Runbook>): Promise<Runbook> => {
+    const response = await apiClient.post<{ data: Runbook }>(`/api/v1/alert-rules/${ruleId}/runbooks`, runbook)
+    return response.data.data
+  },
+
+  // Update a runbook
+  updateRunbook: async (id: string, runbook: Partial<Runbook>): Promise<Runbook> => {
+    const response = await apiClient.put<{ data: Runbook }>(`/api/v1/runbooks/${id}`, runbook)
+    return response.data.data
+  },
+
+  // Delete a runbook and its history
+  deleteRunbook: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/runbooks/${id}`)
+  },
+
+  // Run a runbook for a firing alert of its rule
+  executeRunbook: async (id: string, alertId: string): Promise<RunbookExecution> => {
+    const response = await apiClient.post<{ data: RunbookExecution }>(`/api/v1/runbooks/${id}/execute`, { alertId })
+    return response.data.data
+  },
+
+  // List runbook executions, newest first
+  listExecutions: async (params: {
+    runbookId?: string
+    alertId?: string
+    page?: number
+    pageSize?: number
+  } = {}): Promise<RunbookExecutionsResponse> => {
+    const response = await apiClient.get<{ data: RunbookExecutionsResponse }>('/api/v1/runbook-executions', { params })
+    return response.data.data
+  },
+}
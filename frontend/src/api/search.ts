@@ -0,0 +1,9 @@
+import { apiClient } from './client'
+import type { SearchParams, SearchResponse } from '../types/search'
+
+export const searchApi = {
+  search: async (params: SearchParams, signal?: AbortSignal): Promise<SearchResponse> => {
+    const response = await apiClient.get<{ data: SearchResponse }>('/api/v1/search', { params, signal })
+    return response.data.data
+  },
+}
@@ -0,0 +1,40 @@
+import { apiClient } from './client'
+import type { CreateSLORequest, SLO, SLOHistory, UpdateSLORequest } from '../types/slo'
+
+export const sloApi = {
+  list: async (): Promise<SLO[]> => {
+    const response = await apiClient.get<{ data: { data: SLO[] } }>('/api/v1/slos')
+    return response.data.data.data
+  },
+
+  get: async (id: string): Promise<SLO> => {
+    const response = await apiClient.get<{ data: SLO }>(`/api/v1/slos/${id}`)
+    return response.data.data
+  },
+
+  create: async (request: CreateSLORequest): Promise<SLO> => {
+    const response = await apiClient.post<{ data: SLO }>('/api/v1/slos', request)
+    return response.data.data
+  },
+
+  update: async (id: string, request: UpdateSLORequest): Promise<SLO> => {
+    const response = await apiClient.put<{ data: SLO }>(`/api/v1/slos/${id}`, request)
+    return response.data.data
+  },
+
+  delete: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/slos/${id}`)
+  },
+
+  // Evaluate now instead of waiting for the next minute
+  evaluate: async (id: string): Promise<SLO> => {
+    const response = await apiClient.post<{ data: SLO }>(`/api/v1/slos/${id}/evaluate`)
+    return response.data.data
+  },
+
+  // Error budget burn-down, by default over the last SLO window
+  history: async (id: string, params?: { start?: string; end?: string }): Promise<SLOHistory> => {
+    const response = await apiClient.get<{ data: SLOHistory }>(`/api/v1/slos/${id}/history`, { params })
+    return response.data.data
+  },
+}
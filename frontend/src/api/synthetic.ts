@@ -0,0 +1,53 @@
+import { apiClient } from './client'
+import type {
+  CreateSyntheticCheckRequest,
+  SyntheticCheck,
+  SyntheticResult,
+  SyntheticResultList,
+  SyntheticResultParams,
+  SyntheticUptime,
+  UpdateSyntheticCheckRequest,
+} from '../types/synthetic'
+
+export const syntheticApi = {
+  list: async (): Promise<SyntheticCheck[]> => {
+    const response = await apiClient.get<{ data: { data: SyntheticCheck[] } }>('/api/v1/synthetics')
+    return response.data.data.data
+  },
+
+  get: async (id: string): Promise<SyntheticCheck> => {
+    const response = await apiClient.get<{ data: SyntheticCheck }>(`/api/v1/synthetics/${id}`)
+    return response.data.data
+  },
+
+  create: async (request: CreateSyntheticCheckRequest): Promise<SyntheticCheck> => {
+    const response = await apiClient.post<{ data: SyntheticCheck }>('/api/v1/synthetics', request)
+    return response.data.data
+  },
+
+  update: async (id: string, request: UpdateSyntheticCheckRequest): Promise<SyntheticCheck> => {
+    const response = await apiClient.put<{ data: SyntheticCheck }>(`/api/v1/synthetics/${id}`, request)
+    return response.data.data
+  },
+
+  delete: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/synthetics/${id}`)
+  },
+
+  // Run from all locations now instead of waiting for the interval
+  run: async (id: string): Promise<SyntheticResult[]> => {
+    const response = await apiClient.post<{ data: { data: SyntheticResult[] } }>(`/api/v1/synthetics/${id}/run`)
+    return response.data.data.data
+  },
+
+  results: async (id: string, params?: SyntheticResultParams): Promise<SyntheticResultList> => {
+    const response = await apiClient.get<{ data: SyntheticResultList }>(`/api/v1/synthetics/${id}/results`, { params })
+    return response.data.data
+  },
+
+  // Uptime overall and per location, by default over the last day
+  uptime: async (id: string, params?: { start?: string; end?: string }): Promise<SyntheticUptime> => {
+    const response = await apiClient.get<{ data: SyntheticUptime }>(`/api/v1/synthetics/${id}/uptime`, { params })
+    return response.data.data
+  },
+}
@@ -0,0 +1,30 @@
+import { apiClient } from './client'
+import type { BulkTagRequest, BulkTagResult, TagKey, TagResourceType, Tags } from '../types/tag'
+
+export const tagApi = {
+  // Tags of resources by resource ID; resources without tags are left out
+  get: async (resourceType: TagResourceType, ids: string[]): Promise<Record<string, Tags>> => {
+    const response = await apiClient.get<{ data: { tags: Record<string, Tags> } }>('/api/v1/tags', {
+      params: { resourceType, ids: ids.join(',') },
+    })
+    return response.data.data.tags
+  },
+
+  // Replace every tag of a resource
+  set: async (resourceType: TagResourceType, id: string, tags: Tags): Promise<Tags> => {
+    const response = await apiClient.put<{ data: { tags: Tags } }>(`/api/v1/tags/${resourceType}/${id}`, { tags })
+    return response.data.data.tags
+  },
+
+  bulk: async (req: BulkTagRequest): Promise<BulkTagResult> => {
+    const response = await apiClient.post<{ data: BulkTagResult }>('/api/v1/tags/bulk', req)
+    return response.data.data
+  },
+
+  keys: async (resourceType?: TagResourceType): Promise<TagKey[]> => {
+    const response = await apiClient.get<{ data: { keys: TagKey[] } }>('/api/v1/tags/keys', {
+      params: { resourceType },
+    })
+    return response.data.data.keys
+  },
+}
@@ -0,0 +1,60 @@
+// Ticketing integration API client
+import { apiClient } from './client'
+import type {
+  AlertTicket,
+  CreatedTicketIntegration,
+  TicketIntegration,
+  TicketIntegrationRequest,
+} from '../types/ticketing'
+
+export const ticketingApi = {
+  listIntegrations: async (): Promise<TicketIntegration[]> => {
+    const response = await apiClient.get<{ data: { data: TicketIntegration[]; total: number } }>(
+      '/api/v1/ticketing/integrations'
+    )
+    return response.data.data.data
+  },
+
+  // The inbound token authenticates the integration's status webhook and is only returned here
+  createIntegration: async (request: TicketIntegrationRequest): Promise<CreatedTicketIntegration> => {
+    const response = await apiClient.post<{ data: CreatedTicketIntegration }>('/api/v1/ticketing/integrations', request)
+    return response.data.data
+  },
+
+  updateIntegration: async (id: string, request: TicketIntegrationRequest): Promise<TicketIntegration> => {
+    const response = await apiClient.put<{ data: TicketIntegration }>(`/api/v1/ticketing/integrations/${id}`, request)
+    return response.data.data
+  },
+
+  deleteIntegration: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/ticketing/integrations/${id}`)
+  },
+
+  // Check the credentials without opening an issue
+  testIntegration: async (id: string): Promise<void> => {
+    await apiClient.post(`/api/v1/ticketing/integrations/${id}/test`)
+  },
+
+  rotateInboundToken: async (id: string): Promise<string> => {
+    const response = await apiClient.post<{ data: { inboundToken: string } }>(
+      `/api/v1/ticketing/integrations/${id}/inbound-token`
+    )
+    return response.data.data.inboundToken
+  },
+
+  listAlertTickets: async (alertId: string): Promise<AlertTicket[]> => {
+    const response = await apiClient.get<{ data: { data: AlertTicket[]; total: number } }>(
+      `/api/v1/alerts/${alertId}/tickets`
+    )
+    return response.data.data.data
+  },
+
+  // Queue opening an issue for an alert, whatever its severity
+  openAlertTicket: async (alertId: string, integrationId: string): Promise<void> => {
+    await apiClient.post(`/api/v1/alerts/${alertId}/tickets`, { integrationId })
+  },
+}
+
+// inboundWebhookUrl is where a ticketing system posts its issue events
+export const inboundWebhookUrl = (integrationId: string): string =>
+  `${apiClient.defaults.baseURL}/api/v1/ticketing/inbound/${integrationId}`
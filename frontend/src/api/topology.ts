@@ -0,0 +1,24 @@
+// Topology map API client
+import { apiClient } from './client'
+import type { TopologyGraph, TopologyParams } from '../types/topology'
+
+const API_BASE_URL = import.meta.env.VITE_API_BASE_URL || 'http://localhost:8080'
+
+export const topologyApi = {
+  // Get the map of clusters and managed hosts
+  getTopology: async (params: TopologyParams = {}): Promise<TopologyGraph> => {
+    const queryParams = new URLSearchParams()
+
+    if (params.clusterIds?.length) queryParams.append('clusterIds', params.clusterIds.join(','))
+    if (params.namespace) queryParams.append('namespace', params.namespace)
+    if (params.kinds?.length) queryParams.append('kinds', params.kinds.join(','))
+    if (params.health) queryParams.append('health', params.health)
+    if (params.hosts === false) queryParams.append('hosts', 'false')
+
+    const response = await apiClient.get<{ data: TopologyGraph }>(`/api/v1/topology?${queryParams.toString()}`)
+    return response.data.data
+  },
+
+  // URL of the event stream carrying topology changes
+  changesUrl: (): string => `${API_BASE_URL.replace('http', 'ws')}/api/v1/events/ws?types=topology.changed`,
+}
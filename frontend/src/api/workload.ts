@@ -9,6 +9,7 @@ import type {
   DeploymentsResponse,
   PodsResponse,
   ServicesResponse,
+  WatchParams,
 } from '../types/workload'
 
 const API_BASE_URL = import.meta.env.VITE_API_BASE_URL || 'http://localhost:8080'
@@ -65,6 +66,20 @@ export const workloadApi = {
     return response.data.data.logs
   },
 
+  // URL of the websocket streaming changes to a namespace's pods, deployments and events
+  watchUrl: (params: WatchParams): string => {
+    const queryParams = new URLSearchParams()
+
+    queryParams.append('clusterId', params.clusterId)
+    queryParams.append('namespace', params.namespace)
+    if (params.kinds?.length) queryParams.append('kinds', params.kinds.join(','))
+    if (params.labelSelector) queryParams.append('labelSelector', params.labelSelector)
+    if (params.name) queryParams.append('name', params.name)
+    if (params.resourceVersion) queryParams.append('resourceVersion', params.resourceVersion)
+
+    return `${API_BASE_URL.replace('http', 'ws')}/api/v1/clusters/watch/ws?${queryParams.toString()}`
+  },
+
   // Delete pod
   deletePod: async (clusterId: string, namespace: string, podName: string): Promise<void> => {
     await axios.delete(
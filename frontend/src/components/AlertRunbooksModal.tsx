@@ -0,0 +1,171 @@
+import React from 'react'
+import { useQuery } from '@tanstack/react-query'
+import { Button, Modal, Table, Tag, Typography, message } from 'antd'
+import { PlayCircleOutlined } from '@ant-design/icons'
+import type { ColumnsType } from 'antd/es/table'
+import { Link } from 'react-router-dom'
+import { runbookApi } from '../api/runbook'
+import type { Alert } from '../types/alert'
+import type { Runbook, RunbookExecution, RunbookExecutionStatus } from '../types/runbook'
+
+const { Text } = Typography
+
+const actionLabels: Record<Runbook['action'], string> = {
+  batch_task: 'Batch task',
+  restart_deployment: 'Restart deployment',
+  scale_deployment: 'Scale up deployment',
+}
+
+const statusColors: Record<RunbookExecutionStatus, string> = {
+  running: 'processing',
+  succeeded: 'success',
+  failed: 'error',
+  skipped: 'default',
+}
+
+interface AlertRunbooksModalProps {
+  alert?: Alert
+  onClose: () => void
+}
+
+// AlertRunbooksModal lists the runbooks of an alert's rule with one-click runs,
+// and the runs made for the alert
+export const AlertRunbooksModal: React.FC<AlertRunbooksModalProps> = ({ alert, onClose }) => {
+  const { data: runbooks, isLoading: runbooksLoading } = useQuery({
+    queryKey: ['runbooks', alert?.ruleId],
+    queryFn: () => runbookApi.listRunbooks(alert!.ruleId),
+    enabled: !!alert,
+  })
+
+  const { data: executions, isLoading: executionsLoading, refetch: refetchExecutions } = useQuery({
+    queryKey: ['runbookExecutions', alert?.id],
+    queryFn: () => runbookApi.listExecutions({ alertId: alert!.id, pageSize: 50 }),
+    enabled: !!alert,
+    refetchInterval: 5000,
+  })
+
+  const handleRun = async (runbook: Runbook) => {
+    try {
+      await runbookApi.executeRunbook(runbook.id, alert!.id)
+      message.success(`Runbook ${runbook.name} started`)
+      refetchExecutions()
+    } catch (error: any) {
+      message.error(`Failed to run runbook: ${error.response?.data?.message || error.message}`)
+    }
+  }
+
+  const runbookName = (id: string) => runbooks?.find((r) => r.id === id)?.name || id
+
+  const runbookColumns: ColumnsType<Runbook> = [
+    {
+      title: 'Name',
+      dataIndex: 'name',
+      key: 'name',
+      render: (name: string, record: Runbook) => (
+        <div>
+          <div>{name}</div>
+          {record.description && <Text type="secondary" style={{ fontSize: 12 }}>{record.description}</Text>}
+        </div>
+      ),
+    },
+    {
+      title: 'Action',
+      key: 'action',
+      render: (_: any, record: Runbook) =>
+        record.action === 'batch_task'
+          ? actionLabels[record.action]
+          : `${actionLabels[record.action]} ${record.namespace}/${record.deployment}`,
+    },
+    {
+      title: 'Trigger',
+      dataIndex: 'trigger',
+      key: 'trigger',
+      render: (trigger: Runbook['trigger']) => <Tag>{trigger === 'auto' ? 'Automatic' : 'One-click'}</Tag>,
+    },
+    {
+      title: 'Guardrails',
+      key: 'guardrails',
+      render: (_: any, record: Runbook) =>
+        `${Math.round(record.cooldown / 60)}m cooldown, ${record.maxPerHour ? `${record.maxPerHour}/hour` : 'no hourly limit'}`,
+    },
+    {
+      title: '',
+      key: 'run',
+      render: (_: any, record: Runbook) => (
+        <Button
+          size="small"
+          icon={<PlayCircleOutlined />}
+          disabled={!record.enabled || alert?.status === 'resolved'}
+          onClick={() => handleRun(record)}
+        >
+          Run
+        </Button>
+      ),
+    },
+  ]
+
+  const executionColumns: ColumnsType<RunbookExecution> = [
+    {
+      title: 'Runbook',
+      dataIndex: 'runbookId',
+      key: 'runbookId',
+      render: (id: string) => runbookName(id),
+    },
+    {
+      title: 'Trigger',
+      dataIndex: 'trigger',
+      key: 'trigger',
+      render: (trigger: RunbookExecution['trigger']) => (trigger === 'auto' ? 'Automatic' : 'Manual'),
+    },
+    {
+      title: 'Status',
+      dataIndex: 'status',
+      key: 'status',
+      render: (status: RunbookExecutionStatus) => <Tag color={statusColors[status]}>{status}</Tag>,
+    },
+    {
+      title: 'Result',
+      key: 'message',
+      render: (_: any, record: RunbookExecution) => (
+        <span>
+          {record.message}
+          {record.batchTaskId && (
+            <>
+              {' '}
+              <Link to={`/batch-tasks/${record.batchTaskId}`}>View task</Link>
+            </>
+          )}
+        </span>
+      ),
+    },
+    {
+      title: 'Started',
+      dataIndex: 'startedAt',
+      key: 'startedAt',
+      render: (date: string) => new Date(date).toLocaleString(),
+    },
+  ]
+
+  return (
+    <Modal title={alert ? `Runbooks: ${alert.title}` : 'Runbooks'} open={!!alert} onCancel={onClose} footer={null} width={900}>
+      <Table
+        columns={runbookColumns}
+        dataSource={runbooks || []}
+        rowKey="id"
+        loading={runbooksLoading}
+        pagination={false}
+        size="small"
+        locale={{ emptyText: 'No runbooks are attached to this alert rule' }}
+      />
+      <h4 style={{ marginTop: 24 }}>Executions for this alert</h4>
+      <Table
+        columns={executionColumns}
+        dataSource={executions?.data || []}
+        rowKey="id"
+        loading={executionsLoading}
+        pagination={false}
+        size="small"
+      />
+    </Modal>
+  )
+}
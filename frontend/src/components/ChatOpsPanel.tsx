@@ -0,0 +1,325 @@
+import React, { useState } from 'react'
+import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query'
+import { Button, Card, Form, Input, Modal, Popconfirm, Select, Space, Switch, Table, Tag, Typography, message } from 'antd'
+import { DeleteOutlined, DisconnectOutlined, EditOutlined, LinkOutlined, PlusOutlined, TeamOutlined } from '@ant-design/icons'
+import type { ColumnsType } from 'antd/es/table'
+import { chatCommandUrl, chatopsApi } from '../api/chatops'
+import type { ChatOpsIntegration, ChatOpsIntegrationRequest, ChatProvider, ChatUserLink } from '../types/chatops'
+
+const { Text, Paragraph } = Typography
+
+const providerLabels: Record<ChatProvider, string> = {
+  slack: 'Slack',
+  teams: 'Microsoft Teams',
+}
+
+const errorMessage = (error: any) => error.response?.data?.error?.message || error.message
+
+// ChatOpsPanel manages the Slack and Teams integrations alert and task commands
+// are run from, and the chat accounts linked to the signed-in user
+export const ChatOpsPanel: React.FC = () => {
+  const queryClient = useQueryClient()
+  const [form] = Form.useForm()
+  const [editing, setEditing] = useState<{ open: boolean; integration?: ChatOpsIntegration }>({ open: false })
+  const [setup, setSetup] = useState<ChatOpsIntegration>()
+  const [linksOf, setLinksOf] = useState<ChatOpsIntegration>()
+  const [code, setCode] = useState('')
+  const provider: ChatProvider = Form.useWatch('provider', form) || editing.integration?.provider || 'slack'
+
+  const { data: integrations = [], isLoading } = useQuery({
+    queryKey: ['chatopsIntegrations'],
+    queryFn: () => chatopsApi.listIntegrations(),
+  })
+
+  const { data: links = [], isLoading: linksLoading } = useQuery({
+    queryKey: ['chatLinks'],
+    queryFn: () => chatopsApi.listLinks(),
+  })
+
+  const { data: integrationLinks = [], isLoading: integrationLinksLoading } = useQuery({
+    queryKey: ['chatopsIntegrationLinks', linksOf?.id],
+    queryFn: () => chatopsApi.listIntegrationLinks(linksOf!.id),
+    enabled: !!linksOf,
+  })
+
+  const refresh = () => queryClient.invalidateQueries({ queryKey: ['chatopsIntegrations'] })
+  const refreshLinks = () => {
+    queryClient.invalidateQueries({ queryKey: ['chatLinks'] })
+    queryClient.invalidateQueries({ queryKey: ['chatopsIntegrationLinks'] })
+  }
+
+  const save = useMutation({
+    mutationFn: async (values: any) => {
+      const request: ChatOpsIntegrationRequest = { ...values, signingSecret: values.signingSecret || undefined }
+      if (editing.integration) {
+        await chatopsApi.updateIntegration(editing.integration.id, { ...request, provider: undefined })
+        return undefined
+      }
+      return chatopsApi.createIntegration(request)
+    },
+    onSuccess: (created) => {
+      message.success(editing.integration ? 'Integration updated' : 'Integration created')
+      if (created) setSetup(created)
+      setEditing({ open: false })
+      form.resetFields()
+      refresh()
+    },
+    onError: (error: any) => message.error(`Failed to save integration: ${errorMessage(error)}`),
+  })
+
+  const confirmLink = useMutation({
+    mutationFn: (value: string) => chatopsApi.confirmLink(value.trim().toUpperCase()),
+    onSuccess: (link) => {
+      message.success(`Linked ${link.externalName || link.externalUserId}`)
+      setCode('')
+      refreshLinks()
+    },
+    onError: (error: any) => message.error(`Failed to link chat account: ${errorMessage(error)}`),
+  })
+
+  const handleDelete = async (integration: ChatOpsIntegration) => {
+    try {
+      await chatopsApi.deleteIntegration(integration.id)
+      message.success('Integration deleted')
+      refresh()
+      refreshLinks()
+    } catch (error: any) {
+      message.error(`Failed to delete integration: ${errorMessage(error)}`)
+    }
+  }
+
+  const handleUnlink = async (link: ChatUserLink) => {
+    try {
+      await chatopsApi.deleteLink(link.id)
+      message.success('Chat account unlinked')
+      refreshLinks()
+    } catch (error: any) {
+      message.error(`Failed to unlink chat account: ${errorMessage(error)}`)
+    }
+  }
+
+  const openEditor = (integration?: ChatOpsIntegration) => {
+    form.resetFields()
+    form.setFieldsValue(integration ? { ...integration } : { provider: 'slack', enabled: true })
+    setEditing({ open: true, integration })
+  }
+
+  const columns: ColumnsType<ChatOpsIntegration> = [
+    {
+      title: 'Name',
+      key: 'name',
+      render: (_, integration) => (
+        <Space direction="vertical" size={0}>
+          <Text strong>{integration.name}</Text>
+          {integration.teamId && <Text type="secondary">{integration.teamId}</Text>}
+        </Space>
+      ),
+    },
+    {
+      title: 'Provider',
+      dataIndex: 'provider',
+      key: 'provider',
+      width: 150,
+      render: (value: ChatProvider) => <Tag>{providerLabels[value]}</Tag>,
+    },
+    {
+      title: 'Last Command',
+      dataIndex: 'lastCommandAt',
+      key: 'lastCommandAt',
+      width: 180,
+      render: (date?: string) => (date ? new Date(date).toLocaleString() : <Text type="secondary">Never</Text>),
+    },
+    {
+      title: 'Status',
+      key: 'status',
+      width: 100,
+      render: (_, integration) => (
+        <Tag color={integration.enabled ? 'green' : 'default'}>{integration.enabled ? 'Enabled' : 'Disabled'}</Tag>
+      ),
+    },
+    {
+      title: 'Actions',
+      key: 'actions',
+      width: 220,
+      render: (_, integration) => (
+        <Space>
+          <Button size="small" onClick={() => setSetup(integration)}>
+            Setup
+          </Button>
+          <Button size="small" icon={<TeamOutlined />} onClick={() => setLinksOf(integration)} />
+          <Button size="small" icon={<EditOutlined />} onClick={() => openEditor(integration)} />
+          <Popconfirm
+            title="Delete this integration?"
+            description="The chat accounts linked through it are unlinked."
+            onConfirm={() => handleDelete(integration)}
+          >
+            <Button size="small" danger icon={<DeleteOutlined />} />
+          </Popconfirm>
+        </Space>
+      ),
+    },
+  ]
+
+  const linkColumns = (owner: boolean): ColumnsType<ChatUserLink> => [
+    {
+      title: 'Chat Account',
+      key: 'account',
+      render: (_, link) => (
+        <Space direction="vertical" size={0}>
+          <Text strong>{link.externalName || link.externalUserId}</Text>
+          <Text type="secondary">{link.externalUserId}</Text>
+        </Space>
+      ),
+    },
+    ...(owner
+      ? []
+      : [
+          {
+            title: 'Integration',
+            key: 'integration',
+            render: (_: any, link: ChatUserLink) =>
+              link.integration ? `${link.integration.name} (${providerLabels[link.integration.provider]})` : '-',
+          },
+        ]),
+    {
+      title: 'Linked',
+      dataIndex: 'linkedAt',
+      key: 'linkedAt',
+      width: 180,
+      render: (date?: string) => (date ? new Date(date).toLocaleString() : <Tag>Pending</Tag>),
+    },
+    {
+      title: 'Actions',
+      key: 'actions',
+      width: 80,
+      render: (_, link) => (
+        <Popconfirm title="Unlink this chat account?" onConfirm={() => handleUnlink(link)}>
+          <Button size="small" danger icon={<DisconnectOutlined />} />
+        </Popconfirm>
+      ),
+    },
+  ]
+
+  return (
+    <div>
+      <Card size="small" title="My Chat Accounts" style={{ marginBottom: 16 }}>
+        <Space style={{ marginBottom: 16 }}>
+          <Input
+            style={{ width: 200 }}
+            placeholder="Link code"
+            value={code}
+            onChange={(e) => setCode(e.target.value)}
+            onPressEnter={() => code && confirmLink.mutate(code)}
+          />
+          <Button
+            type="primary"
+            icon={<LinkOutlined />}
+            disabled={!code}
+            loading={confirmLink.isPending}
+            onClick={() => confirmLink.mutate(code)}
+          >
+            Link Chat Account
+          </Button>
+          <Text type="secondary">Send the link command in Slack or Teams to get a code</Text>
+        </Space>
+        <Table
+          columns={linkColumns(false)}
+          dataSource={links}
+          rowKey="id"
+          loading={linksLoading}
+          size="small"
+          pagination={false}
+        />
+      </Card>
+
+      <Space style={{ marginBottom: 16 }}>
+        <Button type="primary" icon={<PlusOutlined />} onClick={() => openEditor()}>
+          Add Integration
+        </Button>
+        <Text type="secondary">List, acknowledge and silence alerts and run batch tasks from Slack or Teams</Text>
+      </Space>
+
+      <Table columns={columns} dataSource={integrations} rowKey="id" loading={isLoading} size="small" pagination={false} />
+
+      <Modal
+        open={editing.open}
+        title={editing.integration ? `Edit ${editing.integration.name}` : 'Add ChatOps Integration'}
+        width={560}
+        okText="Save"
+        confirmLoading={save.isPending}
+        onOk={() => form.validateFields().then((values) => save.mutate(values))}
+        onCancel={() => setEditing({ open: false })}
+      >
+        <Form form={form} layout="vertical">
+          <Form.Item name="name" label="Name" rules={[{ required: true, message: 'Please enter a name' }]}>
+            <Input />
+          </Form.Item>
+          <Form.Item name="provider" label="Provider">
+            <Select disabled={!!editing.integration}>
+              <Select.Option value="slack">Slack</Select.Option>
+              <Select.Option value="teams">Microsoft Teams</Select.Option>
+            </Select>
+          </Form.Item>
+          <Form.Item
+            name="signingSecret"
+            label={provider === 'slack' ? 'Signing secret' : 'Security token'}
+            rules={[{ required: !editing.integration, message: 'Please enter the secret' }]}
+            extra={
+              editing.integration
+                ? 'Leave empty to keep the current one'
+                : provider === 'slack'
+                  ? 'From the Basic Information page of the Slack app'
+                  : 'Shown once when the outgoing webhook is created'
+            }
+          >
+            <Input.Password />
+          </Form.Item>
+          <Form.Item
+            name="teamId"
+            label={provider === 'slack' ? 'Team ID' : 'Tenant ID'}
+            extra="Commands from any workspace are accepted when empty"
+          >
+            <Input />
+          </Form.Item>
+          <Form.Item name="enabled" label="Enabled" valuePropName="checked">
+            <Switch />
+          </Form.Item>
+        </Form>
+      </Modal>
+
+      <Modal open={!!setup} title="Chat Setup" footer={null} onCancel={() => setSetup(undefined)}>
+        {setup?.provider === 'teams' ? (
+          <Paragraph>
+            Create an outgoing webhook in the Teams team with this callback URL, and save its security token on the
+            integration. Mention the webhook followed by a command, such as <Text code>help</Text>.
+          </Paragraph>
+        ) : (
+          <Paragraph>
+            Create a <Text code>/myops</Text> slash command in the Slack app with this request URL, and enable
+            interactivity with the same URL so the buttons on alerts work. Try <Text code>/myops help</Text>.
+          </Paragraph>
+        )}
+        <Paragraph copyable code>
+          {setup && chatCommandUrl(setup.id)}
+        </Paragraph>
+      </Modal>
+
+      <Modal
+        open={!!linksOf}
+        title={`Chat Accounts Linked Through ${linksOf?.name}`}
+        width={640}
+        footer={null}
+        onCancel={() => setLinksOf(undefined)}
+      >
+        <Table
+          columns={linkColumns(true)}
+          dataSource={integrationLinks}
+          rowKey="id"
+          loading={integrationLinksLoading}
+          size="small"
+          pagination={false}
+        />
+      </Modal>
+    </div>
+  )
+}
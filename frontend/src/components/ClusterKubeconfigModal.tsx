@@ -0,0 +1,136 @@
+import React, { useState } from 'react'
+import { Alert, Button, Form, Input, InputNumber, Modal, Space, Tag, Typography, message } from 'antd'
+import { CopyOutlined, DownloadOutlined } from '@ant-design/icons'
+import { clusterApi } from '../api/cluster'
+import type { ScopedKubeconfig } from '../types/cluster'
+
+const { Paragraph, Text } = Typography
+
+// ClusterKubeconfigModal issues the user a time-limited kubeconfig for a cluster
+// that only carries their own permissions on it
+export const ClusterKubeconfigModal: React.FC<{
+  open: boolean
+  clusterId: string
+  clusterName: string
+  onClose: () => void
+}> = ({ open, clusterId, clusterName, onClose }) => {
+  const [form] = Form.useForm()
+  const [issuing, setIssuing] = useState(false)
+  const [revoking, setRevoking] = useState(false)
+  const [issued, setIssued] = useState<ScopedKubeconfig>()
+
+  const errorMessage = (error: any) => error.response?.data?.error?.message || error.message
+
+  const issue = async () => {
+    const values = await form.validateFields()
+    setIssuing(true)
+    try {
+      setIssued(
+        await clusterApi.issueKubeconfig(clusterId, {
+          namespace: values.namespace?.trim() || undefined,
+          ttlMinutes: values.ttlMinutes,
+        })
+      )
+    } catch (error: any) {
+      message.error(`Failed to issue kubeconfig: ${errorMessage(error)}`)
+    } finally {
+      setIssuing(false)
+    }
+  }
+
+  const revoke = async () => {
+    setRevoking(true)
+    try {
+      await clusterApi.revokeKubeconfig(clusterId, form.getFieldValue('namespace')?.trim() || undefined)
+      message.success('Kubeconfig revoked')
+      setIssued(undefined)
+    } catch (error: any) {
+      message.error(`Failed to revoke kubeconfig: ${errorMessage(error)}`)
+    } finally {
+      setRevoking(false)
+    }
+  }
+
+  const download = () => {
+    if (!issued) return
+    const blob = new Blob([issued.kubeconfig], { type: 'application/yaml' })
+    const url = URL.createObjectURL(blob)
+    const link = document.createElement('a')
+    link.href = url
+    link.download = `kubeconfig-${clusterName}${issued.namespace ? `-${issued.namespace}` : ''}.yaml`
+    link.click()
+    URL.revokeObjectURL(url)
+  }
+
+  const close = () => {
+    setIssued(undefined)
+    form.resetFields()
+    onClose()
+  }
+
+  return (
+    <Modal
+      open={open}
+      title={`Kubeconfig for ${clusterName}`}
+      onCancel={close}
+      width={640}
+      footer={
+        <Space>
+          <Button danger loading={revoking} onClick={revoke}>
+            Revoke
+          </Button>
+          <Button type="primary" loading={issuing} onClick={issue}>
+            {issued ? 'Issue Again' : 'Issue'}
+          </Button>
+        </Space>
+      }
+    >
+      <Paragraph type="secondary">
+        The kubeconfig authenticates as a service account that holds only your platform permissions on this
+        cluster. Pod permissions are only carried by namespace kubeconfigs.
+      </Paragraph>
+      <Form form={form} layout="inline" initialValues={{ ttlMinutes: 60 }}>
+        <Form.Item
+          name="namespace"
+          label="Namespace"
+          rules={[{ pattern: /^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$/, message: 'Invalid namespace' }]}
+        >
+          <Input placeholder="All namespaces" style={{ width: 200 }} />
+        </Form.Item>
+        <Form.Item name="ttlMinutes" label="Valid for (minutes)">
+          <InputNumber min={10} max={1440} />
+        </Form.Item>
+      </Form>
+
+      {issued && (
+        <div style={{ marginTop: 16 }}>
+          <Alert
+            type="success"
+            showIcon
+            message={`Expires ${new Date(issued.expiresAt).toLocaleString()}`}
+            description={
+              <Space size={[0, 4]} wrap>
+                {issued.permissions.map((permission) => (
+                  <Tag key={permission}>{permission}</Tag>
+                ))}
+              </Space>
+            }
+          />
+          <Input.TextArea value={issued.kubeconfig} readOnly autoSize={{ minRows: 6, maxRows: 12 }} style={{ marginTop: 12, fontFamily: 'monospace' }} />
+          <Space style={{ marginTop: 8 }}>
+            <Button icon={<DownloadOutlined />} onClick={download}>
+              Download
+            </Button>
+            <Button
+              icon={<CopyOutlined />}
+              onClick={() => navigator.clipboard.writeText(issued.kubeconfig).then(() => message.success('Copied'))}
+            >
+              Copy
+            </Button>
+            <Text type="secondary">Authenticates as {issued.serviceAccount}</Text>
+          </Space>
+        </div>
+      )}
+    </Modal>
+  )
+}
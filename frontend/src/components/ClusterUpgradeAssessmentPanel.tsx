@@ -0,0 +1,131 @@
+import React, { useState } from 'react'
+import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query'
+import { Alert, Button, Empty, Input, Space, Statistic, Table, Tag, Typography, message } from 'antd'
+import { SafetyCertificateOutlined } from '@ant-design/icons'
+import type { ColumnsType } from 'antd/es/table'
+import { clusterApi } from '../api/cluster'
+import type { DeprecatedAPIFinding } from '../types/cluster'
+
+const { Text } = Typography
+
+// ClusterUpgradeAssessmentPanel assesses a cluster for the deprecated and removed
+// APIs its objects and Helm releases use ahead of a Kubernetes upgrade
+export const ClusterUpgradeAssessmentPanel: React.FC<{ clusterId: string }> = ({ clusterId }) => {
+  const queryClient = useQueryClient()
+  const [targetVersion, setTargetVersion] = useState('')
+
+  const { data: assessment, isLoading } = useQuery({
+    queryKey: ['cluster-upgrade-assessment', clusterId],
+    queryFn: () => clusterApi.getUpgradeAssessment(clusterId, 'latest').catch((error) => {
+      if (error.response?.status === 404) return null
+      throw error
+    }),
+    refetchInterval: (query) => (query.state.data?.status === 'pending' ? 3000 : false),
+  })
+
+  const run = useMutation({
+    mutationFn: () => clusterApi.runUpgradeAssessment(clusterId, targetVersion.trim() || undefined),
+    onSuccess: () => {
+      message.success('Upgrade assessment queued')
+      queryClient.invalidateQueries({ queryKey: ['cluster-upgrade-assessment', clusterId] })
+    },
+    onError: (error: any) => {
+      message.error(`Failed to run assessment: ${error.response?.data?.error?.message || error.message}`)
+    },
+  })
+
+  const columns: ColumnsType<DeprecatedAPIFinding> = [
+    {
+      title: 'Severity',
+      dataIndex: 'severity',
+      key: 'severity',
+      width: 100,
+      render: (severity: string) => <Tag color={severity === 'critical' ? 'red' : 'orange'}>{severity}</Tag>,
+    },
+    {
+      title: 'Object',
+      key: 'object',
+      render: (_, finding) => (
+        <Space direction="vertical" size={0}>
+          <Text strong>
+            {finding.kind} {finding.namespace ? `${finding.namespace}/` : ''}
+            {finding.name}
+          </Text>
+          <Text type="secondary">
+            {finding.source === 'helm' ? `Helm release ${finding.release}` : `Live, written by ${finding.manager || 'unknown'}`}
+          </Text>
+        </Space>
+      ),
+    },
+    {
+      title: 'API Version',
+      key: 'apiVersion',
+      render: (_, finding) => (
+        <Space direction="vertical" size={0}>
+          <Text code>{finding.apiVersion}</Text>
+          <Text type="secondary">
+            Deprecated {finding.deprecatedIn}, removed {finding.removedIn}
+          </Text>
+        </Space>
+      ),
+    },
+    {
+      title: 'Replacement',
+      key: 'replacement',
+      render: (_, finding) => (finding.replacement ? <Text code>{finding.replacement}</Text> : <Text type="secondary">{finding.notes}</Text>),
+    },
+  ]
+
+  return (
+    <div>
+      <Space style={{ marginBottom: 16 }}>
+        <Input
+          placeholder="Target version, e.g. 1.29"
+          value={targetVersion}
+          onChange={(e) => setTargetVersion(e.target.value)}
+          style={{ width: 220 }}
+        />
+        <Button
+          type="primary"
+          icon={<SafetyCertificateOutlined />}
+          loading={run.isPending}
+          disabled={assessment?.status === 'pending'}
+          onClick={() => run.mutate()}
+        >
+          Assess Upgrade
+        </Button>
+        <Text type="secondary">Defaults to the next minor release</Text>
+      </Space>
+
+      {!isLoading && !assessment && <Empty description="No upgrade assessment yet" />}
+
+      {assessment && (
+        <>
+          {assessment.status === 'pending' && (
+            <Alert style={{ marginBottom: 16 }} type="info" showIcon message={`Scanning for an upgrade to ${assessment.targetVersion}...`} />
+          )}
+          {assessment.status === 'failed' && (
+            <Alert style={{ marginBottom: 16 }} type="error" showIcon message="Assessment failed" description={assessment.error} />
+          )}
+          {assessment.status === 'completed' && (
+            <Space size={48} style={{ marginBottom: 16 }}>
+              <Statistic title="Current Version" value={assessment.currentVersion || '-'} />
+              <Statistic title="Target Version" value={assessment.targetVersion} />
+              <Statistic title="Critical" value={assessment.critical} valueStyle={{ color: assessment.critical ? '#cf1322' : undefined }} />
+              <Statistic title="Warnings" value={assessment.warnings} valueStyle={{ color: assessment.warnings ? '#d46b08' : undefined }} />
+            </Space>
+          )}
+          {assessment.status === 'completed' && (
+            <Table
+              columns={columns}
+              dataSource={assessment.findings || []}
+              rowKey={(finding) => `${finding.source}/${finding.release || ''}/${finding.apiVersion}/${finding.kind}/${finding.namespace || ''}/${finding.name}`}
+              size="small"
+              locale={{ emptyText: `Nothing uses an API deprecated or removed by ${assessment.targetVersion}` }}
+            />
+          )}
+        </>
+      )}
+    </div>
+  )
+}
@@ -0,0 +1,179 @@
+import React, { useEffect, useMemo, useState } from 'react'
+import { useNavigate } from 'react-router-dom'
+import { useQuery } from '@tanstack/react-query'
+import { Button, Empty, Input, Modal, Spin, Tag, Typography } from 'antd'
+import {
+  AlertOutlined,
+  AppstoreOutlined,
+  BlockOutlined,
+  ClusterOutlined,
+  CodeSandboxOutlined,
+  DashboardOutlined,
+  DesktopOutlined,
+  ExportOutlined,
+  SearchOutlined,
+} from '@ant-design/icons'
+import { searchApi } from '../api/search'
+import type { SearchResult, SearchResultType } from '../types/search'
+
+const { Text } = Typography
+
+const typeConfig: Record<SearchResultType, { label: string; icon: React.ReactNode }> = {
+  host: { label: 'Hosts', icon: <DesktopOutlined /> },
+  cluster: { label: 'Clusters', icon: <ClusterOutlined /> },
+  deployment: { label: 'Deployments', icon: <AppstoreOutlined /> },
+  pod: { label: 'Pods', icon: <CodeSandboxOutlined /> },
+  helm_release: { label: 'Helm Releases', icon: <BlockOutlined /> },
+  dashboard: { label: 'Dashboards', icon: <DashboardOutlined /> },
+  alert_rule: { label: 'Alert Rules', icon: <AlertOutlined /> },
+}
+
+// Typing waits this long before searching
+const SEARCH_DEBOUNCE_MS = 150
+
+// GlobalSearch is a command palette searching the inventory, opened with Ctrl+K
+// or ⌘K. Arrow keys move between results and Enter opens one.
+export const GlobalSearch: React.FC = () => {
+  const navigate = useNavigate()
+  const [open, setOpen] = useState(false)
+  const [input, setInput] = useState('')
+  const [query, setQuery] = useState('')
+  const [active, setActive] = useState(0)
+
+  useEffect(() => {
+    const onKeyDown = (e: KeyboardEvent) => {
+      if ((e.ctrlKey || e.metaKey) && e.key.toLowerCase() === 'k') {
+        e.preventDefault()
+        setOpen(true)
+      }
+    }
+    window.addEventListener('keydown', onKeyDown)
+    return () => window.removeEventListener('keydown', onKeyDown)
+  }, [])
+
+  useEffect(() => {
+    const timer = setTimeout(() => setQuery(input.trim()), SEARCH_DEBOUNCE_MS)
+    return () => clearTimeout(timer)
+  }, [input])
+
+  const { data, isFetching } = useQuery({
+    queryKey: ['globalSearch', query],
+    queryFn: ({ signal }) => searchApi.search({ q: query }, signal),
+    enabled: open && (query.length >= 2 || query.includes('=')),
+    placeholderData: (previous) => previous,
+    staleTime: 10000,
+  })
+  const results = useMemo(() => data?.results || [], [data])
+
+  useEffect(() => {
+    setActive(0)
+  }, [results])
+
+  const close = () => {
+    setOpen(false)
+    setInput('')
+    setQuery('')
+  }
+
+  const openResult = (result: SearchResult) => {
+    if (result.external) {
+      window.open(result.link, '_blank', 'noopener')
+    } else {
+      navigate(result.link)
+    }
+    close()
+  }
+
+  const onInputKeyDown = (e: React.KeyboardEvent) => {
+    if (results.length === 0) return
+    if (e.key === 'ArrowDown') {
+      e.preventDefault()
+      setActive((active + 1) % results.length)
+    } else if (e.key === 'ArrowUp') {
+      e.preventDefault()
+      setActive((active - 1 + results.length) % results.length)
+    } else if (e.key === 'Enter') {
+      e.preventDefault()
+      openResult(results[active])
+    }
+  }
+
+  const context = (result: SearchResult) =>
+    [result.clusterName && result.type !== 'cluster' ? result.clusterName : '', result.namespace, result.description]
+      .filter(Boolean)
+      .join(' / ')
+
+  return (
+    <>
+      <Button icon={<SearchOutlined />} onClick={() => setOpen(true)} style={{ width: 260, textAlign: 'left' }}>
+        <Text type="secondary">Search… (Ctrl+K)</Text>
+      </Button>
+      <Modal open={open} onCancel={close} footer={null} closable={false} width={640} destroyOnClose>
+        <Input
+          autoFocus
+          size="large"
+          prefix={<SearchOutlined />}
+          suffix={isFetching ? <Spin size="small" /> : null}
+          placeholder="Hosts, clusters, pods, deployments, dashboards, alert rules, releases… or app=web"
+          value={input}
+          onChange={(e) => setInput(e.target.value)}
+          onKeyDown={onInputKeyDown}
+        />
+        <div style={{ maxHeight: 420, overflowY: 'auto', marginTop: 12 }}>
+          {query.length > 0 && results.length === 0 && !isFetching && (
+            <Empty image={Empty.PRESENTED_IMAGE_SIMPLE} description="No matches" />
+          )}
+          {results.map((result, index) => {
+            const firstOfType = index === 0 || results[index - 1].type !== result.type
+            return (
+              <React.Fragment key={`${result.type}-${result.clusterId || ''}-${result.id}`}>
+                {firstOfType && (
+                  <div style={{ padding: '8px 8px 4px', fontSize: 12, color: '#999' }}>
+                    {typeConfig[result.type].label}
+                  </div>
+                )}
+                <div
+                  onClick={() => openResult(result)}
+                  onMouseEnter={() => setActive(index)}
+                  style={{
+                    display: 'flex',
+                    alignItems: 'center',
+                    gap: 8,
+                    padding: '6px 8px',
+                    borderRadius: 4,
+                    cursor: 'pointer',
+                    background: index === active ? '#f0f2ff' : undefined,
+                  }}
+                >
+                  {typeConfig[result.type].icon}
+                  <div style={{ flex: 1, minWidth: 0 }}>
+                    <div style={{ overflow: 'hidden', textOverflow: 'ellipsis', whiteSpace: 'nowrap' }}>
+                      {result.name}
+                      {result.label && (
+                        <Tag style={{ marginLeft: 8 }} color="blue">
+                          {result.label}
+                        </Tag>
+                      )}
+                    </div>
+                    {context(result) && (
+                      <Text type="secondary" style={{ fontSize: 12 }} ellipsis>
+                        {context(result)}
+                      </Text>
+                    )}
+                  </div>
+                  {result.status && <Tag>{result.status}</Tag>}
+                  {result.external && <ExportOutlined style={{ color: '#999' }} />}
+                </div>
+              </React.Fragment>
+            )
+          })}
+          {data?.indexing && (
+            <Text type="secondary" style={{ display: 'block', padding: 8, fontSize: 12 }}>
+              Some clusters are still being indexed; their pods and deployments may be missing.
+            </Text>
+          )}
+        </div>
+      </Modal>
+    </>
+  )
+}
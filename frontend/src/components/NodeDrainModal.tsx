@@ -0,0 +1,103 @@
+import React, { useState } from 'react'
+import { Alert, Checkbox, Form, InputNumber, Modal, Progress, Typography, message } from 'antd'
+import { clusterApi } from '../api/cluster'
+import { operationApi } from '../api/operation'
+import type { DrainNodeResult } from '../types/cluster'
+import type { Operation } from '../types/operation'
+
+const { Paragraph } = Typography
+
+// NodeDrainModal cordons a node and evicts its pods, following the drain's progress
+export const NodeDrainModal: React.FC<{
+  clusterId: string
+  node?: string
+  onClose: () => void
+  onDrained: () => void
+}> = ({ clusterId, node, onClose, onDrained }) => {
+  const [form] = Form.useForm()
+  const [operation, setOperation] = useState<Operation<DrainNodeResult>>()
+
+  const running = operation?.status === 'pending' || operation?.status === 'running'
+
+  const drain = async () => {
+    if (!node) return
+    const values = await form.validateFields()
+    try {
+      const accepted = await clusterApi.drainNode(clusterId, node, {
+        gracePeriodSeconds: values.gracePeriodSeconds ?? undefined,
+        ignoreDaemonSets: values.ignoreDaemonSets,
+        deleteEmptyDirData: values.deleteEmptyDirData,
+        force: values.force,
+        timeoutSeconds: values.timeoutMinutes * 60,
+      })
+      setOperation(accepted.operation)
+      const done = await operationApi.wait<DrainNodeResult>(accepted.operationId, { onProgress: setOperation })
+      if (done.status === 'succeeded') {
+        message.success(`Drained ${node}: ${done.result?.evicted.length ?? 0} pods evicted`)
+      }
+      onDrained()
+    } catch (error: any) {
+      message.error(`Failed to drain node: ${error.response?.data?.error?.message || error.message}`)
+    }
+  }
+
+  const close = () => {
+    if (running && operation) {
+      operationApi.cancel(operation.id).catch(() => undefined)
+    }
+    setOperation(undefined)
+    form.resetFields()
+    onClose()
+  }
+
+  return (
+    <Modal
+      open={!!node}
+      title={`Drain ${node}`}
+      okText="Drain"
+      okButtonProps={{ danger: true, loading: running, disabled: operation?.status === 'succeeded' }}
+      cancelText={running ? 'Cancel Drain' : 'Close'}
+      onOk={drain}
+      onCancel={close}
+    >
+      <Paragraph type="secondary">
+        The node is cordoned and its pods are evicted, respecting PodDisruptionBudgets. It stays cordoned until
+        uncordoned.
+      </Paragraph>
+      <Form
+        form={form}
+        layout="vertical"
+        disabled={running}
+        initialValues={{ ignoreDaemonSets: true, deleteEmptyDirData: false, force: false, timeoutMinutes: 10 }}
+      >
+        <Form.Item name="ignoreDaemonSets" valuePropName="checked" style={{ marginBottom: 4 }}>
+          <Checkbox>Ignore DaemonSet pods</Checkbox>
+        </Form.Item>
+        <Form.Item name="deleteEmptyDirData" valuePropName="checked" style={{ marginBottom: 4 }}>
+          <Checkbox>Evict pods with emptyDir data</Checkbox>
+        </Form.Item>
+        <Form.Item name="force" valuePropName="checked">
+          <Checkbox>Evict pods not managed by a controller</Checkbox>
+        </Form.Item>
+        <Form.Item name="gracePeriodSeconds" label="Grace period (seconds)" extra="Each pod's own grace period when empty">
+          <InputNumber min={0} style={{ width: 200 }} />
+        </Form.Item>
+        <Form.Item name="timeoutMinutes" label="Timeout (minutes)">
+          <InputNumber min={1} max={60} style={{ width: 200 }} />
+        </Form.Item>
+      </Form>
+
+      {operation && (
+        <>
+          <Progress
+            percent={operation.progress}
+            status={operation.status === 'failed' ? 'exception' : operation.status === 'succeeded' ? 'success' : 'active'}
+          />
+          {operation.message && <Paragraph type="secondary">{operation.message}</Paragraph>}
+          {operation.status === 'failed' && <Alert type="error" showIcon message="Drain failed" description={operation.error} />}
+          {operation.status === 'cancelled' && <Alert type="warning" showIcon message="Drain cancelled; the node stays cordoned" />}
+        </>
+      )}
+    </Modal>
+  )
+}
@@ -148,7 +148,8 @@ export const PodTerminal: React.FC<PodTerminalProps> = ({
 
     const wsUrl = `${API_BASE_URL.replace('http', 'ws')}/api/v1/clusters/pod-terminal/ws?clusterId=${clusterId}&namespace=${namespace}&podName=${podName}&container=${selectedContainer}&shell=${selectedShell}`
 
-    wsRef.current = new WebSocket(wsUrl)
+    // Browsers cannot set headers on websockets; the token rides in the subprotocol
+    wsRef.current = new WebSocket(wsUrl, ['bearer', localStorage.getItem('token') || ''])
 
     wsRef.current.onopen = () => {
       setIsConnecting(false)
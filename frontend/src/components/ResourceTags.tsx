@@ -0,0 +1,180 @@
+import React, { useEffect, useMemo, useState } from 'react'
+import { useQuery } from '@tanstack/react-query'
+import { AutoComplete, Button, Form, Input, Modal, Select, Space, Tag, Typography, message } from 'antd'
+import { MinusCircleOutlined, PlusOutlined } from '@ant-design/icons'
+import { tagApi } from '../api/tag'
+import type { TagResourceType, Tags } from '../types/tag'
+
+const { Text } = Typography
+
+// ResourceTagList shows the tags of a resource as key=value chips
+export const ResourceTagList: React.FC<{ tags?: Tags }> = ({ tags }) => {
+  const entries = Object.entries(tags || {})
+  if (entries.length === 0) return <Text type="secondary">-</Text>
+  return (
+    <Space size={[0, 4]} wrap>
+      {entries.map(([key, value]) => (
+        <Tag key={key} color="geekblue">
+          {value ? `${key}=${value}` : key}
+        </Tag>
+      ))}
+    </Space>
+  )
+}
+
+// useResourceTags loads the tags of the listed resources, by resource ID
+export const useResourceTags = (resourceType: TagResourceType, ids: string[]) =>
+  useQuery({
+    queryKey: ['resourceTags', resourceType, ids],
+    queryFn: () => tagApi.get(resourceType, ids),
+    enabled: ids.length > 0,
+  })
+
+// TagSelectorInput is a filter over tags, a label selector such as
+// env=prod,team in (payments). Keys and values in use are suggested.
+export const TagSelectorInput: React.FC<{
+  resourceType: TagResourceType
+  value?: string
+  onChange: (selector: string | undefined) => void
+}> = ({ resourceType, value, onChange }) => {
+  const [input, setInput] = useState(value || '')
+  const { data: keys } = useQuery({
+    queryKey: ['tagKeys', resourceType],
+    queryFn: () => tagApi.keys(resourceType),
+    staleTime: 60000,
+  })
+
+  useEffect(() => setInput(value || ''), [value])
+
+  // Suggest completions of the requirement being typed, after the last comma
+  const options = useMemo(() => {
+    const cut = input.lastIndexOf(',') + 1
+    const head = input.slice(0, cut)
+    const current = input.slice(cut).trim()
+    return (keys || [])
+      .flatMap((key) => key.values.map((v) => `${key.key}=${v}`))
+      .filter((requirement) => requirement.startsWith(current) && requirement !== current)
+      .slice(0, 10)
+      .map((requirement) => ({ value: head + requirement }))
+  }, [keys, input])
+
+  return (
+    <AutoComplete options={options} value={input} onChange={setInput} style={{ width: 280 }}>
+      <Input.Search
+        allowClear
+        placeholder="Tags, e.g. env=prod,team in (a,b)"
+        onSearch={(selector) => onChange(selector.trim() || undefined)}
+      />
+    </AutoComplete>
+  )
+}
+
+interface TagRow {
+  key: string
+  value?: string
+}
+
+const rowsToTags = (rows?: TagRow[]): Tags =>
+  Object.fromEntries((rows || []).filter((row) => row.key).map((row) => [row.key.trim(), (row.value || '').trim()]))
+
+// TagEditorModal replaces the tags of one resource when given its current tags,
+// and otherwise adds and removes tags on every resource at once
+export const TagEditorModal: React.FC<{
+  open: boolean
+  resourceType: TagResourceType
+  resources: { id: string; name: string }[]
+  tags?: Tags // The current tags of the one resource being edited
+  onClose: () => void
+  onSaved: () => void
+}> = ({ open, resourceType, resources, tags, onClose, onSaved }) => {
+  const [form] = Form.useForm()
+  const [saving, setSaving] = useState(false)
+  const bulk = tags === undefined
+
+  useEffect(() => {
+    if (open) {
+      form.setFieldsValue({
+        rows: Object.entries(tags || {}).map(([key, value]) => ({ key, value })),
+        remove: [],
+      })
+    }
+  }, [open, tags, form])
+
+  const save = async () => {
+    const values = await form.validateFields()
+    setSaving(true)
+    try {
+      if (bulk) {
+        const result = await tagApi.bulk({
+          resources: resources.map((resource) => ({ type: resourceType, id: resource.id })),
+          add: rowsToTags(values.rows),
+          remove: values.remove,
+        })
+        if (result.failed?.length) {
+          message.warning(`Tagged ${result.updated} resources, ${result.failed.length} could not be tagged`)
+        } else {
+          message.success(`Tagged ${result.updated} resources`)
+        }
+      } else {
+        await tagApi.set(resourceType, resources[0].id, rowsToTags(values.rows))
+        message.success('Tags saved')
+      }
+      onSaved()
+    } catch (error: any) {
+      message.error(`Failed to save tags: ${error.response?.data?.error?.message || error.message}`)
+    } finally {
+      setSaving(false)
+    }
+  }
+
+  return (
+    <Modal
+      open={open}
+      title={bulk ? `Tag ${resources.length} resource${resources.length === 1 ? '' : 's'}` : `Tags of ${resources[0]?.name || ''}`}
+      okText="Save"
+      confirmLoading={saving}
+      onOk={save}
+      onCancel={onClose}
+      destroyOnClose
+    >
+      <Form form={form} layout="vertical">
+        <Form.Item label={bulk ? 'Add or overwrite' : 'Tags'}>
+          <Form.List name="rows">
+            {(fields, { add, remove }) => (
+              <>
+                {fields.map((field) => (
+                  <Space key={field.key} align="baseline">
+                    <Form.Item
+                      name={[field.name, 'key']}
+                      rules={[
+                        { required: true, message: 'Key is required' },
+                        { pattern: /^([a-z0-9.-]+\/)?[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$/, message: 'Invalid key' },
+                      ]}
+                    >
+                      <Input placeholder="key, e.g. env" style={{ width: 200 }} />
+                    </Form.Item>
+                    <Form.Item
+                      name={[field.name, 'value']}
+                      rules={[{ pattern: /^([A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?)?$/, message: 'Invalid value' }]}
+                    >
+                      <Input placeholder="value, e.g. prod" style={{ width: 200 }} />
+                    </Form.Item>
+                    <MinusCircleOutlined onClick={() => remove(field.name)} />
+                  </Space>
+                ))}
+                <Button type="dashed" icon={<PlusOutlined />} onClick={() => add({ key: '' })}>
+                  Add tag
+                </Button>
+              </>
+            )}
+          </Form.List>
+        </Form.Item>
+        {bulk && (
+          <Form.Item name="remove" label="Remove keys">
+            <Select mode="tags" placeholder="Keys to remove" tokenSeparators={[',']} />
+          </Form.Item>
+        )}
+      </Form>
+    </Modal>
+  )
+}
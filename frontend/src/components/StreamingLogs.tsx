@@ -97,7 +97,8 @@ export const StreamingLogs: React.FC<StreamingLogsProps> = ({
 
     const wsUrl = `${API_BASE_URL.replace('http', 'ws')}/api/v1/clusters/pod-logs/ws?clusterId=${clusterId}&namespace=${namespace}&podName=${podName}&container=${selectedContainer}&tailLines=${tailLines}&follow=true`
 
-    wsRef.current = new WebSocket(wsUrl)
+    // Browsers cannot set headers on websockets; the token rides in the subprotocol
+    wsRef.current = new WebSocket(wsUrl, ['bearer', localStorage.getItem('token') || ''])
 
     wsRef.current.onopen = () => {
       setIsStreaming(true)
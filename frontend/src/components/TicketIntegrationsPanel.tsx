@@ -0,0 +1,293 @@
+import React, { useState } from 'react'
+import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query'
+import { Alert, Button, Form, Input, Modal, Popconfirm, Select, Space, Switch, Table, Tag, Typography, message } from 'antd'
+import { ApiOutlined, DeleteOutlined, EditOutlined, KeyOutlined, PlusOutlined } from '@ant-design/icons'
+import type { ColumnsType } from 'antd/es/table'
+import { inboundWebhookUrl, ticketingApi } from '../api/ticketing'
+import type { TicketIntegration, TicketIntegrationRequest, TicketProvider } from '../types/ticketing'
+
+const { Text, Paragraph } = Typography
+const { TextArea } = Input
+
+const providerLabels: Record<TicketProvider, string> = {
+  jira: 'Jira',
+  servicenow: 'ServiceNow',
+}
+
+const errorMessage = (error: any) => error.response?.data?.error?.message || error.message
+
+// TicketIntegrationsPanel manages the Jira and ServiceNow integrations that open,
+// update and resolve issues as alerts fire and resolve
+export const TicketIntegrationsPanel: React.FC = () => {
+  const queryClient = useQueryClient()
+  const [form] = Form.useForm()
+  const [editing, setEditing] = useState<{ open: boolean; integration?: TicketIntegration }>({ open: false })
+  const [inbound, setInbound] = useState<{ id: string; token: string }>()
+  const provider: TicketProvider = Form.useWatch('provider', form) || editing.integration?.provider || 'jira'
+
+  const { data: integrations = [], isLoading } = useQuery({
+    queryKey: ['ticketIntegrations'],
+    queryFn: () => ticketingApi.listIntegrations(),
+  })
+
+  const refresh = () => queryClient.invalidateQueries({ queryKey: ['ticketIntegrations'] })
+
+  const save = useMutation({
+    mutationFn: async (values: any) => {
+      const request: TicketIntegrationRequest = {
+        ...values,
+        fields: values.fields ? JSON.parse(values.fields) : {},
+        token: values.token || undefined,
+      }
+      if (editing.integration) {
+        await ticketingApi.updateIntegration(editing.integration.id, { ...request, provider: undefined })
+        return undefined
+      }
+      return ticketingApi.createIntegration(request)
+    },
+    onSuccess: (created) => {
+      message.success(editing.integration ? 'Integration updated' : 'Integration created')
+      if (created) setInbound({ id: created.integration.id, token: created.inboundToken })
+      setEditing({ open: false })
+      form.resetFields()
+      refresh()
+    },
+    onError: (error: any) => message.error(`Failed to save integration: ${errorMessage(error)}`),
+  })
+
+  const handleTest = async (integration: TicketIntegration) => {
+    try {
+      await ticketingApi.testIntegration(integration.id)
+      message.success(`Connected to ${providerLabels[integration.provider]}`)
+    } catch (error: any) {
+      message.error(`Connection failed: ${errorMessage(error)}`)
+    }
+  }
+
+  const handleRotate = async (integration: TicketIntegration) => {
+    try {
+      const token = await ticketingApi.rotateInboundToken(integration.id)
+      setInbound({ id: integration.id, token })
+    } catch (error: any) {
+      message.error(`Failed to rotate token: ${errorMessage(error)}`)
+    }
+  }
+
+  const handleDelete = async (integration: TicketIntegration) => {
+    try {
+      await ticketingApi.deleteIntegration(integration.id)
+      message.success('Integration deleted')
+      refresh()
+    } catch (error: any) {
+      message.error(`Failed to delete integration: ${errorMessage(error)}`)
+    }
+  }
+
+  const openEditor = (integration?: TicketIntegration) => {
+    form.resetFields()
+    form.setFieldsValue(
+      integration
+        ? { ...integration, fields: Object.keys(integration.fields).length ? JSON.stringify(integration.fields, null, 2) : '' }
+        : { provider: 'jira', enabled: true, syncStatus: true, severities: ['critical'] }
+    )
+    setEditing({ open: true, integration })
+  }
+
+  const columns: ColumnsType<TicketIntegration> = [
+    {
+      title: 'Name',
+      key: 'name',
+      render: (_, integration) => (
+        <Space direction="vertical" size={0}>
+          <Text strong>{integration.name}</Text>
+          <Text type="secondary">{integration.baseUrl}</Text>
+        </Space>
+      ),
+    },
+    {
+      title: 'Provider',
+      dataIndex: 'provider',
+      key: 'provider',
+      width: 120,
+      render: (value: TicketProvider) => <Tag>{providerLabels[value]}</Tag>,
+    },
+    {
+      title: 'Opens',
+      key: 'mapping',
+      render: (_, integration) => (
+        <Space direction="vertical" size={0}>
+          <Text>
+            {integration.issueType}
+            {integration.project ? ` in ${integration.project}` : ''}
+          </Text>
+          <Text type="secondary">
+            For {integration.severities.length ? integration.severities.join(', ') : 'all'} alerts
+          </Text>
+        </Space>
+      ),
+    },
+    {
+      title: 'Status',
+      key: 'status',
+      width: 160,
+      render: (_, integration) => (
+        <Space size={4} wrap>
+          <Tag color={integration.enabled ? 'green' : 'default'}>{integration.enabled ? 'Enabled' : 'Disabled'}</Tag>
+          {integration.syncStatus && <Tag color="blue">Syncs status</Tag>}
+        </Space>
+      ),
+    },
+    {
+      title: 'Actions',
+      key: 'actions',
+      width: 260,
+      render: (_, integration) => (
+        <Space>
+          <Button size="small" icon={<ApiOutlined />} onClick={() => handleTest(integration)}>
+            Test
+          </Button>
+          <Button size="small" icon={<EditOutlined />} onClick={() => openEditor(integration)} />
+          <Popconfirm
+            title="Rotate the inbound webhook token?"
+            description="The ticketing system must be given the new token."
+            onConfirm={() => handleRotate(integration)}
+          >
+            <Button size="small" icon={<KeyOutlined />} />
+          </Popconfirm>
+          <Popconfirm
+            title="Delete this integration?"
+            description="Issues it opened stay in the ticketing system."
+            onConfirm={() => handleDelete(integration)}
+          >
+            <Button size="small" danger icon={<DeleteOutlined />} />
+          </Popconfirm>
+        </Space>
+      ),
+    },
+  ]
+
+  return (
+    <div>
+      <Space style={{ marginBottom: 16 }}>
+        <Button type="primary" icon={<PlusOutlined />} onClick={() => openEditor()}>
+          Add Integration
+        </Button>
+        <Text type="secondary">Open issues in Jira or ServiceNow as alerts fire, and resolve them with the alert</Text>
+      </Space>
+
+      <Table columns={columns} dataSource={integrations} rowKey="id" loading={isLoading} size="small" pagination={false} />
+
+      <Modal
+        open={editing.open}
+        title={editing.integration ? `Edit ${editing.integration.name}` : 'Add Ticketing Integration'}
+        width={640}
+        okText="Save"
+        confirmLoading={save.isPending}
+        onOk={() => form.validateFields().then((values) => save.mutate(values))}
+        onCancel={() => setEditing({ open: false })}
+      >
+        <Form form={form} layout="vertical">
+          <Form.Item name="name" label="Name" rules={[{ required: true, message: 'Please enter a name' }]}>
+            <Input />
+          </Form.Item>
+          <Form.Item name="provider" label="Provider">
+            <Select disabled={!!editing.integration}>
+              <Select.Option value="jira">Jira</Select.Option>
+              <Select.Option value="servicenow">ServiceNow</Select.Option>
+            </Select>
+          </Form.Item>
+          <Form.Item name="baseUrl" label="Base URL" rules={[{ required: true, message: 'Please enter the base URL' }]}>
+            <Input placeholder={provider === 'jira' ? 'https://example.atlassian.net' : 'https://example.service-now.com'} />
+          </Form.Item>
+          <Space style={{ display: 'flex' }} align="start">
+            <Form.Item name="username" label="Username" extra="Empty sends the token as a bearer token">
+              <Input style={{ width: 280 }} />
+            </Form.Item>
+            <Form.Item
+              name="token"
+              label={provider === 'jira' ? 'API token' : 'Password'}
+              rules={[{ required: !editing.integration, message: 'Please enter the token' }]}
+              extra={editing.integration ? 'Leave empty to keep the current one' : undefined}
+            >
+              <Input.Password style={{ width: 280 }} />
+            </Form.Item>
+          </Space>
+          <Space style={{ display: 'flex' }} align="start">
+            <Form.Item
+              name="project"
+              label={provider === 'jira' ? 'Project key' : 'Assignment group'}
+              rules={[{ required: provider === 'jira', message: 'Please enter the project key' }]}
+            >
+              <Input style={{ width: 280 }} />
+            </Form.Item>
+            <Form.Item name="issueType" label={provider === 'jira' ? 'Issue type' : 'Table'}>
+              <Input style={{ width: 280 }} placeholder={provider === 'jira' ? 'Task' : 'incident'} />
+            </Form.Item>
+          </Space>
+          <Form.Item name="severities" label="Alert severities" extra="Alerts of every severity open issues when empty">
+            <Select mode="multiple">
+              <Select.Option value="critical">Critical</Select.Option>
+              <Select.Option value="warning">Warning</Select.Option>
+              <Select.Option value="info">Info</Select.Option>
+            </Select>
+          </Form.Item>
+          <Form.Item name="summaryTemplate" label="Summary template" extra="Go template over .Alert, .Labels and .Annotations">
+            <Input placeholder="[{{.Alert.Severity}}] {{.Alert.Title}}" />
+          </Form.Item>
+          <Form.Item name="descriptionTemplate" label="Description template">
+            <TextArea rows={4} placeholder="{{.Alert.Description}}" />
+          </Form.Item>
+          <Form.Item
+            name="fields"
+            label="Field templates"
+            extra='JSON object of field to template; templates rendering JSON are sent as JSON, e.g. {"priority": "{\"name\": \"High\"}"}'
+            rules={[
+              {
+                validator: (_, value) => {
+                  if (!value) return Promise.resolve()
+                  try {
+                    JSON.parse(value)
+                    return Promise.resolve()
+                  } catch {
+                    return Promise.reject(new Error('Field templates must be a JSON object'))
+                  }
+                },
+              },
+            ]}
+          >
+            <TextArea rows={3} style={{ fontFamily: 'monospace' }} />
+          </Form.Item>
+          <Form.Item
+            name="resolveTransition"
+            label={provider === 'jira' ? 'Resolve transition' : 'Resolved state'}
+            extra={provider === 'jira' ? 'Any transition into Done when the workflow has none of this name' : 'Incident state 6 (Resolved) by default'}
+          >
+            <Input placeholder={provider === 'jira' ? 'Done' : '6'} />
+          </Form.Item>
+          <Space size={32}>
+            <Form.Item name="enabled" label="Enabled" valuePropName="checked">
+              <Switch />
+            </Form.Item>
+            <Form.Item name="syncStatus" label="Resolve alerts whose issue is closed" valuePropName="checked">
+              <Switch />
+            </Form.Item>
+          </Space>
+        </Form>
+      </Modal>
+
+      <Modal open={!!inbound} title="Inbound Webhook" footer={null} onCancel={() => setInbound(undefined)}>
+        <Alert type="warning" showIcon style={{ marginBottom: 16 }} message="The token is only shown now. Store it in the ticketing system." />
+        <Paragraph>
+          Have the ticketing system POST its issue events to this URL, with the token as a bearer token in the
+          Authorization header, to sync issue status right away. Open issues are also polled every few minutes.
+        </Paragraph>
+        <Paragraph copyable code>
+          {inbound && inboundWebhookUrl(inbound.id)}
+        </Paragraph>
+        <Paragraph copyable code>
+          {inbound?.token}
+        </Paragraph>
+      </Modal>
+    </div>
+  )
+}
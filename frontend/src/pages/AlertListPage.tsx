@@ -1,5 +1,6 @@
 import React, { useState } from 'react'
 import { useQuery } from '@tanstack/react-query'
+import { useSearchParams } from 'react-router-dom'
 import { Button, Space, message, Table, Tag, Tabs, Row, Col, Statistic, Card, Modal, Form, Input, Select, InputNumber } from 'antd'
 import {
   BellOutlined,
@@ -15,16 +16,22 @@ import {
 import type { ColumnsType } from 'antd/es/table'
 import { alertApi } from '../api/alert'
 import type { Alert, AlertRule, AlertSeverity, AlertStatus } from '../types/alert'
+import { AlertRunbooksModal } from '../components/AlertRunbooksModal'
+import { TicketIntegrationsPanel } from '../components/TicketIntegrationsPanel'
+import { ChatOpsPanel } from '../components/ChatOpsPanel'
 
 const { Option } = Select
 const { TextArea } = Input
 
 export const AlertListPage: React.FC = () => {
-  const [activeTab, setActiveTab] = useState('alerts')
+  // Links from search open the rules with ?tab=rules
+  const [searchParams] = useSearchParams()
+  const [activeTab, setActiveTab] = useState(searchParams.get('tab') || 'alerts')
   const [alertStatus] = useState<string>('')
   const [ruleModal, setRuleModal] = useState<{ visible: boolean; rule?: AlertRule }>({
     visible: false,
   })
+  const [runbookAlert, setRunbookAlert] = useState<Alert | undefined>()
 
   const [form] = Form.useForm()
 
@@ -123,10 +130,19 @@ export const AlertListPage: React.FC = () => {
       title: 'Status',
       dataIndex: 'status',
       key: 'status',
-      width: 100,
-      render: (status: AlertStatus) => {
+      width: 170,
+      render: (status: AlertStatus, record: Alert) => {
         const config = getStatusConfig(status)
-        return <Tag color={config.color} icon={config.icon}>{config.label}</Tag>
+        return (
+          <Space size={4} wrap>
+            <Tag color={config.color} icon={config.icon}>{config.label}</Tag>
+            {record.acknowledgedAt && status !== 'resolved' && (
+              <Tag color="blue" title={new Date(record.acknowledgedAt).toLocaleString()}>
+                Acknowledged
+              </Tag>
+            )}
+          </Space>
+        )
       },
     },
     {
@@ -152,10 +168,26 @@ export const AlertListPage: React.FC = () => {
       width: 180,
       render: (date: string) => new Date(date).toLocaleString(),
     },
+    {
+      title: 'Tickets',
+      key: 'tickets',
+      width: 140,
+      render: (_: any, record: Alert) => (
+        <Space size={4} wrap>
+          {(record.tickets || []).map((ticket) => (
+            <a key={ticket.id} href={ticket.url} target="_blank" rel="noreferrer" title={ticket.externalStatus || ticket.error}>
+              <Tag color={ticket.error ? 'error' : ticket.status === 'open' ? 'processing' : 'default'}>
+                {ticket.externalKey}
+              </Tag>
+            </a>
+          ))}
+        </Space>
+      ),
+    },
     {
       title: 'Actions',
       key: 'actions',
-      width: 120,
+      width: 180,
       render: (_: any, record: Alert) => (
         <Space>
           {record.status === 'firing' && (
@@ -163,6 +195,9 @@ export const AlertListPage: React.FC = () => {
               Silence
             </Button>
           )}
+          <Button size="small" onClick={() => setRunbookAlert(record)}>
+            Runbooks
+          </Button>
         </Space>
       ),
     },
@@ -265,6 +300,16 @@ export const AlertListPage: React.FC = () => {
         />
       ),
     },
+    {
+      key: 'ticketing',
+      label: 'Ticketing',
+      children: <TicketIntegrationsPanel />,
+    },
+    {
+      key: 'chatops',
+      label: 'ChatOps',
+      children: <ChatOpsPanel />,
+    },
   ]
 
   return (
@@ -476,6 +521,8 @@ export const AlertListPage: React.FC = () => {
           </Form.Item>
         </Form>
       </Modal>
+
+      <AlertRunbooksModal alert={runbookAlert} onClose={() => setRunbookAlert(undefined)} />
     </div>
   )
 }
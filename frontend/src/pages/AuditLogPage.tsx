@@ -1,6 +1,6 @@
 import React, { useState } from 'react'
-import { useQuery } from '@tanstack/react-query'
-import { Button, Space, Table, Tag, Card, Row, Col, Statistic, Form, Input, Select, DatePicker, Modal } from 'antd'
+import { useMutation, useQuery } from '@tanstack/react-query'
+import { Alert, Button, Space, Table, Tag, Card, Row, Col, Statistic, Form, Input, InputNumber, Select, DatePicker, Modal, message } from 'antd'
 import {
   FileTextOutlined,
   ReloadOutlined,
@@ -9,14 +9,22 @@ import {
   CheckCircleOutlined,
   CloseCircleOutlined,
   EyeOutlined,
+  SafetyCertificateOutlined,
 } from '@ant-design/icons'
 import type { ColumnsType } from 'antd/es/table'
 import dayjs from 'dayjs'
 import { auditApi } from '../api/audit'
-import type { AuditLog } from '../types/audit'
+import type { AuditChainProblem, AuditChainProblemKind, AuditCheckpoint, AuditLog } from '../types/audit'
 
 const { RangePicker } = DatePicker
 
+const problemLabels: Record<AuditChainProblemKind, string> = {
+  gap: 'Missing records',
+  hash_mismatch: 'Record changed',
+  chain_break: 'Chain broken',
+  checkpoint_mismatch: 'Checkpoint mismatch',
+}
+
 export const AuditLogPage: React.FC = () => {
   const [form] = Form.useForm()
   const [page, setPage] = useState(1)
@@ -25,6 +33,8 @@ export const AuditLogPage: React.FC = () => {
   const [detailModal, setDetailModal] = useState<{ visible: boolean; log?: AuditLog }>({
     visible: false,
   })
+  const [integrityOpen, setIntegrityOpen] = useState(false)
+  const [verifyRange, setVerifyRange] = useState<{ from?: number; to?: number }>({})
 
   // Fetch audit logs
   const { data: logsData, isLoading, refetch } = useQuery({
@@ -45,6 +55,20 @@ export const AuditLogPage: React.FC = () => {
 
   const summary = summaryData?.data
 
+  // Fetch the checkpoints of the audit log chain while the integrity view is open
+  const { data: checkpointsData, isLoading: checkpointsLoading } = useQuery({
+    queryKey: ['auditCheckpoints'],
+    queryFn: () => auditApi.getCheckpoints(100),
+    enabled: integrityOpen,
+  })
+
+  const verify = useMutation({
+    mutationFn: () => auditApi.verifyChain(verifyRange),
+    onError: (error: any) =>
+      message.error(`Failed to verify audit logs: ${error.response?.data?.error?.message || error.message}`),
+  })
+  const verification = verify.data
+
   // Handle search
   const handleSearch = () => {
     const values = form.getFieldsValue()
@@ -197,6 +221,62 @@ export const AuditLogPage: React.FC = () => {
 
   const logs = logsData?.data.logs || []
 
+  const problemColumns: ColumnsType<AuditChainProblem> = [
+    { title: 'Sequence', dataIndex: 'sequence', key: 'sequence', width: 110 },
+    {
+      title: 'Problem',
+      dataIndex: 'kind',
+      key: 'kind',
+      width: 170,
+      render: (kind: AuditChainProblemKind) => <Tag color="red">{problemLabels[kind] || kind}</Tag>,
+    },
+    { title: 'Details', dataIndex: 'message', key: 'message' },
+  ]
+
+  const checkpointColumns: ColumnsType<AuditCheckpoint> = [
+    {
+      title: 'Records',
+      key: 'records',
+      width: 160,
+      render: (_, checkpoint) => `${checkpoint.fromSequence} - ${checkpoint.sequence}`,
+    },
+    {
+      title: 'Hash',
+      dataIndex: 'hash',
+      key: 'hash',
+      render: (hash: string) => <code title={hash}>{hash.slice(0, 16)}</code>,
+    },
+    {
+      title: 'Created',
+      dataIndex: 'createdAt',
+      key: 'createdAt',
+      width: 170,
+      render: (date: string) => dayjs(date).format('YYYY-MM-DD HH:mm:ss'),
+    },
+    {
+      title: 'Export',
+      key: 'export',
+      width: 120,
+      render: (_, checkpoint) => {
+        if (checkpoint.exportedAt) {
+          return (
+            <Tag color="green" title={checkpoint.exportKey}>
+              Exported
+            </Tag>
+          )
+        }
+        if (checkpoint.exportError) {
+          return (
+            <Tag color="red" title={checkpoint.exportError}>
+              Failed
+            </Tag>
+          )
+        }
+        return <Tag>{checkpoint.exportTargetId ? 'Pending' : 'Not exported'}</Tag>
+      },
+    },
+  ]
+
   return (
     <div style={{ padding: '24px' }}>
       {/* Header */}
@@ -206,9 +286,14 @@ export const AuditLogPage: React.FC = () => {
             <FileTextOutlined /> Audit Logs
           </span>
         </Space>
-        <Button icon={<ReloadOutlined />} onClick={handleRefresh}>
-          Refresh
-        </Button>
+        <Space>
+          <Button icon={<SafetyCertificateOutlined />} onClick={() => setIntegrityOpen(true)}>
+            Integrity
+          </Button>
+          <Button icon={<ReloadOutlined />} onClick={handleRefresh}>
+            Refresh
+          </Button>
+        </Space>
       </div>
 
       {/* Statistics */}
@@ -397,6 +482,78 @@ export const AuditLogPage: React.FC = () => {
           </div>
         )}
       </Modal>
+
+      {/* Integrity Modal */}
+      <Modal
+        title="Audit Log Integrity"
+        open={integrityOpen}
+        onCancel={() => setIntegrityOpen(false)}
+        footer={[
+          <Button key="close" onClick={() => setIntegrityOpen(false)}>
+            Close
+          </Button>,
+        ]}
+        width={800}
+      >
+        <Space style={{ marginBottom: '16px' }}>
+          <InputNumber
+            min={1}
+            placeholder="From sequence"
+            style={{ width: 150 }}
+            value={verifyRange.from}
+            onChange={(value) => setVerifyRange({ ...verifyRange, from: value ?? undefined })}
+          />
+          <InputNumber
+            min={1}
+            placeholder="To sequence"
+            style={{ width: 150 }}
+            value={verifyRange.to}
+            onChange={(value) => setVerifyRange({ ...verifyRange, to: value ?? undefined })}
+          />
+          <Button
+            type="primary"
+            icon={<SafetyCertificateOutlined />}
+            loading={verify.isPending}
+            onClick={() => verify.mutate()}
+          >
+            Verify
+          </Button>
+        </Space>
+
+        {verification && (
+          <div style={{ marginBottom: '16px' }}>
+            <Alert
+              type={verification.valid ? 'success' : 'error'}
+              showIcon
+              style={{ marginBottom: '8px' }}
+              message={
+                verification.valid
+                  ? `Records ${verification.firstSequence} - ${verification.lastSequence} are intact`
+                  : `${verification.problems.length}${verification.truncated ? '+' : ''} problems found`
+              }
+              description={`${verification.checked} records and ${verification.checkpoints} checkpoints checked, ${verification.unsealed} records not yet sealed`}
+            />
+            {verification.problems.length > 0 && (
+              <Table
+                columns={problemColumns}
+                dataSource={verification.problems}
+                rowKey={(problem) => `${problem.kind}-${problem.sequence}`}
+                size="small"
+                pagination={false}
+              />
+            )}
+          </div>
+        )}
+
+        <Table
+          columns={checkpointColumns}
+          dataSource={checkpointsData?.data || []}
+          rowKey="id"
+          loading={checkpointsLoading}
+          size="small"
+          pagination={{ pageSize: 10 }}
+        />
+      </Modal>
     </div>
   )
 }
@@ -0,0 +1,497 @@
+import React, { useState } from 'react'
+import { useQuery, useMutation, useQueryClient } from '@tanstack/react-query'
+import {
+  Button,
+  Card,
+  Col,
+  Descriptions,
+  Drawer,
+  Form,
+  Input,
+  InputNumber,
+  Modal,
+  Popconfirm,
+  Row,
+  Select,
+  Space,
+  Statistic,
+  Switch,
+  Table,
+  Tag,
+  Tooltip,
+  message,
+} from 'antd'
+import {
+  DeleteOutlined,
+  EditOutlined,
+  PlusOutlined,
+  ReloadOutlined,
+  SafetyCertificateOutlined,
+  SyncOutlined,
+} from '@ant-design/icons'
+import type { ColumnsType } from 'antd/es/table'
+import dayjs from 'dayjs'
+import { certificateApi } from '../api/certificate'
+import { clusterApi } from '../api/cluster'
+import type {
+  Certificate,
+  CertificateSource,
+  CertificateStatus,
+  CreateCertificateRequest,
+} from '../types/certificate'
+
+const statusConfig: Record<CertificateStatus, { color: string; text: string }> = {
+  valid: { color: 'success', text: 'Valid' },
+  warning: { color: 'warning', text: 'Expiring' },
+  critical: { color: 'volcano', text: 'Critical' },
+  expired: { color: 'error', text: 'Expired' },
+  error: { color: 'magenta', text: 'Error' },
+  unknown: { color: 'default', text: 'Unknown' },
+}
+
+const sourceLabels: Record<CertificateSource, string> = {
+  endpoint: 'Endpoint',
+  ingress: 'Ingress',
+  kubeconfig: 'Kubeconfig',
+}
+
+const expiryColor = (days: number) => {
+  if (days < 0) return '#cf1322'
+  if (days <= 7) return '#fa541c'
+  if (days <= 30) return '#faad14'
+  return '#3f8600'
+}
+
+export const CertificatesPage: React.FC = () => {
+  const queryClient = useQueryClient()
+  const [page, setPage] = useState(1)
+  const [source, setSource] = useState<CertificateSource>()
+  const [status, setStatus] = useState<CertificateStatus>()
+  const [clusterId, setClusterId] = useState<string>()
+  const [search, setSearch] = useState('')
+  const [isModalOpen, setIsModalOpen] = useState(false)
+  const [editingCertificate, setEditingCertificate] = useState<Certificate | null>(null)
+  const [selectedCertificate, setSelectedCertificate] = useState<Certificate | null>(null)
+  const [form] = Form.useForm()
+
+  const { data, isLoading, refetch } = useQuery({
+    queryKey: ['certificates', page, source, status, clusterId, search],
+    queryFn: () => certificateApi.list({ page, pageSize: 20, source, status, clusterId, search: search || undefined }),
+    refetchInterval: 60000,
+  })
+  const certificates = data?.data || []
+  const summary = data?.summary || {}
+
+  const { data: clusters } = useQuery({
+    queryKey: ['clusters', 'certificates'],
+    queryFn: () => clusterApi.listClusters({ pageSize: 100 }),
+  })
+  const clusterName = (id?: string) => clusters?.clusters.find((c) => c.id === id)?.name || id
+
+  const onError = (action: string) => (error: any) => {
+    message.error(`Failed to ${action} certificate: ${error.response?.data?.message || error.message}`)
+  }
+
+  const saveMutation = useMutation({
+    mutationFn: (values: CreateCertificateRequest & { enabled?: boolean }) => {
+      if (editingCertificate) {
+        const { host, port, serverName, ...update } = values
+        // Only endpoints can be moved; discovered certificates follow their cluster
+        return certificateApi.update(
+          editingCertificate.id,
+          editingCertificate.source === 'endpoint' ? { ...update, host, port, serverName } : update
+        )
+      }
+      const { enabled: _enabled, ...create } = values
+      return certificateApi.create(create)
+    },
+    onSuccess: (certificate) => {
+      if (certificate.status === 'error') {
+        message.warning(`Certificate saved but could not be read: ${certificate.lastError}`)
+      } else {
+        message.success(editingCertificate ? 'Certificate updated successfully' : 'Certificate added successfully')
+      }
+      setIsModalOpen(false)
+      setEditingCertificate(null)
+      form.resetFields()
+      queryClient.invalidateQueries({ queryKey: ['certificates'] })
+    },
+    onError: onError('save'),
+  })
+
+  const deleteMutation = useMutation({
+    mutationFn: certificateApi.delete,
+    onSuccess: () => {
+      message.success('Certificate deleted successfully')
+      queryClient.invalidateQueries({ queryKey: ['certificates'] })
+    },
+    onError: onError('delete'),
+  })
+
+  const checkMutation = useMutation({
+    mutationFn: certificateApi.check,
+    onSuccess: (certificate) => {
+      if (certificate.status === 'error') {
+        message.warning(`Check failed: ${certificate.lastError}`)
+      } else {
+        message.success(`Certificate is ${statusConfig[certificate.status].text.toLowerCase()}`)
+      }
+      queryClient.invalidateQueries({ queryKey: ['certificates'] })
+    },
+    onError: onError('check'),
+  })
+
+  const scanMutation = useMutation({
+    mutationFn: certificateApi.scan,
+    onSuccess: () => {
+      message.success('Certificates scanned successfully')
+      queryClient.invalidateQueries({ queryKey: ['certificates'] })
+    },
+    onError: onError('scan'),
+  })
+
+  const handleAdd = () => {
+    setEditingCertificate(null)
+    form.resetFields()
+    form.setFieldsValue({ port: 443 })
+    setIsModalOpen(true)
+  }
+
+  const handleEdit = (certificate: Certificate) => {
+    setEditingCertificate(certificate)
+    form.setFieldsValue({
+      name: certificate.name,
+      host: certificate.host,
+      port: certificate.port,
+      serverName: certificate.serverName,
+      warningDays: certificate.warningDays,
+      criticalDays: certificate.criticalDays,
+      enabled: certificate.enabled,
+    })
+    setIsModalOpen(true)
+  }
+
+  const columns: ColumnsType<Certificate> = [
+    {
+      title: 'Name',
+      dataIndex: 'name',
+      key: 'name',
+      render: (name: string, certificate) => (
+        <Space>
+          <a onClick={() => setSelectedCertificate(certificate)}>{name}</a>
+          {!certificate.enabled && <Tag>Disabled</Tag>}
+        </Space>
+      ),
+    },
+    {
+      title: 'Source',
+      dataIndex: 'source',
+      key: 'source',
+      render: (source: CertificateSource) => <Tag>{sourceLabels[source]}</Tag>,
+    },
+    {
+      title: 'Location',
+      key: 'location',
+      ellipsis: true,
+      render: (_: any, certificate) =>
+        certificate.source === 'endpoint'
+          ? `${certificate.host}:${certificate.port}`
+          : `${clusterName(certificate.clusterId)} / ${
+              certificate.namespace ? `${certificate.namespace}/` : ''
+            }${certificate.resource}`,
+    },
+    {
+      title: 'Subject',
+      dataIndex: 'subject',
+      key: 'subject',
+      ellipsis: true,
+    },
+    {
+      title: 'Expires',
+      dataIndex: 'notAfter',
+      key: 'notAfter',
+      render: (notAfter: string | undefined, certificate) => {
+        if (!notAfter || certificate.expiresIn === undefined) return '-'
+        const days = Math.floor(certificate.expiresIn / 86400)
+        return (
+          <Tooltip title={dayjs(notAfter).format('YYYY-MM-DD HH:mm:ss')}>
+            <span style={{ color: expiryColor(days) }}>
+              {days < 0 ? `${-days} days ago` : `in ${days} days`}
+            </span>
+          </Tooltip>
+        )
+      },
+    },
+    {
+      title: 'Status',
+      dataIndex: 'status',
+      key: 'status',
+      render: (status: CertificateStatus, certificate) => (
+        <Tooltip title={certificate.lastError || certificate.verifyError}>
+          <Space size={4}>
+            <Tag color={statusConfig[status].color}>{statusConfig[status].text}</Tag>
+            {certificate.verifyError && <Tag color="orange">Untrusted</Tag>}
+          </Space>
+        </Tooltip>
+      ),
+    },
+    {
+      title: 'Last Checked',
+      dataIndex: 'lastCheckedAt',
+      key: 'lastCheckedAt',
+      render: (time?: string) => (time ? dayjs(time).format('YYYY-MM-DD HH:mm:ss') : '-'),
+    },
+    {
+      title: 'Actions',
+      key: 'actions',
+      render: (_: any, certificate) => (
+        <Space>
+          <Tooltip title="Check now">
+            <Button
+              type="text"
+              icon={<SyncOutlined />}
+              loading={checkMutation.isPending && checkMutation.variables === certificate.id}
+              onClick={() => checkMutation.mutate(certificate.id)}
+            />
+          </Tooltip>
+          <Tooltip title="Edit">
+            <Button type="text" icon={<EditOutlined />} onClick={() => handleEdit(certificate)} />
+          </Tooltip>
+          {certificate.source === 'endpoint' && (
+            <Popconfirm
+              title="Stop monitoring this certificate?"
+              onConfirm={() => deleteMutation.mutate(certificate.id)}
+            >
+              <Button type="text" danger icon={<DeleteOutlined />} />
+            </Popconfirm>
+          )}
+        </Space>
+      ),
+    },
+  ]
+
+  const total = Object.values(summary).reduce((acc, n) => acc + (n || 0), 0)
+
+  return (
+    <div style={{ padding: '24px' }}>
+      <div style={{ marginBottom: '24px', display: 'flex', justifyContent: 'space-between', alignItems: 'center' }}>
+        <span style={{ fontSize: '20px', fontWeight: 'bold' }}>
+          <SafetyCertificateOutlined /> Certificates
+        </span>
+        <Space>
+          <Button icon={<ReloadOutlined />} onClick={() => refetch()}>
+            Refresh
+          </Button>
+          <Button icon={<SyncOutlined />} loading={scanMutation.isPending} onClick={() => scanMutation.mutate()}>
+            Scan Now
+          </Button>
+          <Button type="primary" icon={<PlusOutlined />} onClick={handleAdd}>
+            Add Endpoint
+          </Button>
+        </Space>
+      </div>
+
+      {/* Status summary */}
+      <Row gutter={16} style={{ marginBottom: '24px' }}>
+        <Col span={6}>
+          <Card>
+            <Statistic title="Certificates" value={total} />
+          </Card>
+        </Col>
+        <Col span={6}>
+          <Card>
+            <Statistic title="Expiring" value={summary.warning || 0} valueStyle={{ color: '#faad14' }} />
+          </Card>
+        </Col>
+        <Col span={6}>
+          <Card>
+            <Statistic title="Critical" value={summary.critical || 0} valueStyle={{ color: '#fa541c' }} />
+          </Card>
+        </Col>
+        <Col span={6}>
+          <Card>
+            <Statistic
+              title="Expired / Error"
+              value={(summary.expired || 0) + (summary.error || 0)}
+              valueStyle={{ color: '#cf1322' }}
+            />
+          </Card>
+        </Col>
+      </Row>
+
+      <Card>
+        <Space style={{ marginBottom: 16 }} wrap>
+          <Input.Search
+            allowClear
+            placeholder="Name, host, subject or DNS name"
+            style={{ width: 280 }}
+            onSearch={(value) => {
+              setSearch(value)
+              setPage(1)
+            }}
+          />
+          <Select
+            allowClear
+            placeholder="Source"
+            style={{ width: 140 }}
+            value={source}
+            onChange={(value) => {
+              setSource(value)
+              setPage(1)
+            }}
+            options={Object.entries(sourceLabels).map(([value, label]) => ({ value, label }))}
+          />
+          <Select
+            allowClear
+            placeholder="Status"
+            style={{ width: 140 }}
+            value={status}
+            onChange={(value) => {
+              setStatus(value)
+              setPage(1)
+            }}
+            options={Object.entries(statusConfig).map(([value, config]) => ({ value, label: config.text }))}
+          />
+          <Select
+            allowClear
+            placeholder="Cluster"
+            style={{ width: 200 }}
+            value={clusterId}
+            onChange={(value) => {
+              setClusterId(value)
+              setPage(1)
+            }}
+            options={(clusters?.clusters || []).map((c) => ({ value: c.id, label: c.name }))}
+          />
+        </Space>
+        <Table
+          rowKey="id"
+          columns={columns}
+          dataSource={certificates}
+          loading={isLoading}
+          pagination={{
+            current: page,
+            pageSize: 20,
+            total: data?.total || 0,
+            onChange: setPage,
+            showTotal: (total) => `Total ${total} certificates`,
+          }}
+        />
+      </Card>
+
+      <Drawer
+        title={selectedCertificate?.name}
+        open={!!selectedCertificate}
+        onClose={() => setSelectedCertificate(null)}
+        width={640}
+      >
+        {selectedCertificate && (
+          <Descriptions column={1} bordered size="small">
+            <Descriptions.Item label="Source">{sourceLabels[selectedCertificate.source]}</Descriptions.Item>
+            {selectedCertificate.clusterId && (
+              <Descriptions.Item label="Cluster">{clusterName(selectedCertificate.clusterId)}</Descriptions.Item>
+            )}
+            {selectedCertificate.host && (
+              <Descriptions.Item label="Endpoint">
+                {selectedCertificate.host}:{selectedCertificate.port}
+                {selectedCertificate.serverName && ` (SNI ${selectedCertificate.serverName})`}
+              </Descriptions.Item>
+            )}
+            {selectedCertificate.resource && (
+              <Descriptions.Item label="Resource">
+                {selectedCertificate.namespace ? `${selectedCertificate.namespace}/` : ''}
+                {selectedCertificate.resource}
+              </Descriptions.Item>
+            )}
+            <Descriptions.Item label="Subject">{selectedCertificate.subject || '-'}</Descriptions.Item>
+            <Descriptions.Item label="Issuer">{selectedCertificate.issuer || '-'}</Descriptions.Item>
+            <Descriptions.Item label="DNS Names">
+              {selectedCertificate.dnsNames
+                ? selectedCertificate.dnsNames.split(',').map((name) => <Tag key={name}>{name}</Tag>)
+                : '-'}
+            </Descriptions.Item>
+            <Descriptions.Item label="Valid From">
+              {selectedCertificate.notBefore ? dayjs(selectedCertificate.notBefore).format('YYYY-MM-DD HH:mm:ss') : '-'}
+            </Descriptions.Item>
+            <Descriptions.Item label="Valid Until">
+              {selectedCertificate.notAfter ? dayjs(selectedCertificate.notAfter).format('YYYY-MM-DD HH:mm:ss') : '-'}
+            </Descriptions.Item>
+            <Descriptions.Item label="Serial">
+              <span style={{ fontFamily: 'monospace' }}>{selectedCertificate.serial || '-'}</span>
+            </Descriptions.Item>
+            <Descriptions.Item label="SHA-256">
+              <span style={{ fontFamily: 'monospace', wordBreak: 'break-all' }}>
+                {selectedCertificate.fingerprint || '-'}
+              </span>
+            </Descriptions.Item>
+            {selectedCertificate.verifyError && (
+              <Descriptions.Item label="Verification">{selectedCertificate.verifyError}</Descriptions.Item>
+            )}
+            {selectedCertificate.lastError && (
+              <Descriptions.Item label="Last Error">{selectedCertificate.lastError}</Descriptions.Item>
+            )}
+          </Descriptions>
+        )}
+      </Drawer>
+
+      <Modal
+        title={editingCertificate ? 'Edit Certificate' : 'Add Endpoint'}
+        open={isModalOpen}
+        onCancel={() => {
+          setIsModalOpen(false)
+          setEditingCertificate(null)
+          form.resetFields()
+        }}
+        onOk={() => form.submit()}
+        confirmLoading={saveMutation.isPending}
+        width={560}
+      >
+        <Form form={form} layout="vertical" onFinish={(values) => saveMutation.mutate(values)}>
+          <Form.Item name="name" label="Name" tooltip="host:port when empty">
+            <Input placeholder="e.g. Public website" />
+          </Form.Item>
+          {(!editingCertificate || editingCertificate.source === 'endpoint') && (
+            <>
+              <Row gutter={16}>
+                <Col span={16}>
+                  <Form.Item name="host" label="Host" rules={[{ required: true, message: 'Please enter a host' }]}>
+                    <Input placeholder="example.com" />
+                  </Form.Item>
+                </Col>
+                <Col span={8}>
+                  <Form.Item name="port" label="Port">
+                    <InputNumber min={1} max={65535} style={{ width: '100%' }} />
+                  </Form.Item>
+                </Col>
+              </Row>
+              <Form.Item name="serverName" label="Server Name" tooltip="The SNI to send; the host when empty">
+                <Input placeholder="www.example.com" />
+              </Form.Item>
+            </>
+          )}
+          <Row gutter={16}>
+            <Col span={editingCertificate ? 8 : 12}>
+              <Form.Item name="warningDays" label="Warning (days)" tooltip="Empty uses the platform setting">
+                <InputNumber min={0} style={{ width: '100%' }} />
+              </Form.Item>
+            </Col>
+            <Col span={editingCertificate ? 8 : 12}>
+              <Form.Item name="criticalDays" label="Critical (days)" tooltip="Empty uses the platform setting">
+                <InputNumber min={0} style={{ width: '100%' }} />
+              </Form.Item>
+            </Col>
+            {editingCertificate && (
+              <Col span={8}>
+                <Form.Item name="enabled" label="Monitored" valuePropName="checked">
+                  <Switch />
+                </Form.Item>
+              </Col>
+            )}
+          </Row>
+        </Form>
+      </Modal>
+    </div>
+  )
+}
+
+export default CertificatesPage
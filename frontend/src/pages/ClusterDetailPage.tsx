@@ -10,15 +10,21 @@ import {
   ApiOutlined,
   ContainerOutlined,
   NodeIndexOutlined,
+  KeyOutlined,
 } from '@ant-design/icons'
 import type { ColumnsType } from 'antd/es/table'
 import { clusterApi } from '../api/cluster'
+import { ClusterKubeconfigModal } from '../components/ClusterKubeconfigModal'
+import { ClusterUpgradeAssessmentPanel } from '../components/ClusterUpgradeAssessmentPanel'
+import { NodeDrainModal } from '../components/NodeDrainModal'
 import type { ClusterNode, ClusterStatus } from '../types/cluster'
 
 export const ClusterDetailPage: React.FC = () => {
   const { id } = useParams<{ id: string }>()
   const navigate = useNavigate()
   const [autoRefresh, setAutoRefresh] = useState(false)
+  const [kubeconfigOpen, setKubeconfigOpen] = useState(false)
+  const [drainNode, setDrainNode] = useState<string>()
 
   // Fetch cluster details
   const { data: cluster, isLoading, error, refetch } = useQuery({
@@ -66,6 +72,17 @@ export const ClusterDetailPage: React.FC = () => {
     return configs[status] || configs.pending
   }
 
+  // Cordon or uncordon a node
+  const handleCordon = async (node: ClusterNode) => {
+    try {
+      await clusterApi.setNodeCordoned(id!, node.name, !node.unschedulable)
+      message.success(`${node.name} ${node.unschedulable ? 'uncordoned' : 'cordoned'}`)
+      refetchNodes()
+    } catch (error: any) {
+      message.error(`Failed to update node: ${error.response?.data?.error?.message || error.message}`)
+    }
+  }
+
   // Node table columns
   const nodeColumns: ColumnsType<ClusterNode> = [
     {
@@ -83,9 +100,12 @@ export const ClusterDetailPage: React.FC = () => {
       title: 'Status',
       dataIndex: 'status',
       key: 'status',
-      width: 100,
-      render: (status: string) => (
-        <Tag color={status === 'Ready' ? 'success' : 'error'}>{status}</Tag>
+      width: 160,
+      render: (status: string, record) => (
+        <Space size={0}>
+          <Tag color={status === 'Ready' ? 'success' : 'error'}>{status}</Tag>
+          {record.unschedulable && <Tag color="warning">SchedulingDisabled</Tag>}
+        </Space>
       ),
     },
     {
@@ -141,6 +161,21 @@ export const ClusterDetailPage: React.FC = () => {
       width: 120,
       render: (ip: string) => ip || '-',
     },
+    {
+      title: 'Actions',
+      key: 'actions',
+      width: 170,
+      render: (_, record) => (
+        <Space size="small">
+          <Button size="small" onClick={() => handleCordon(record)}>
+            {record.unschedulable ? 'Uncordon' : 'Cordon'}
+          </Button>
+          <Button size="small" danger onClick={() => setDrainNode(record.name)}>
+            Drain
+          </Button>
+        </Space>
+      ),
+    },
   ]
 
   if (isLoading) {
@@ -298,6 +333,11 @@ export const ClusterDetailPage: React.FC = () => {
         />
       ),
     },
+    {
+      key: 'upgrade',
+      label: 'Upgrade Assessment',
+      children: <ClusterUpgradeAssessmentPanel clusterId={cluster.id} />,
+    },
   ]
 
   return (
@@ -325,6 +365,9 @@ export const ClusterDetailPage: React.FC = () => {
           >
             Refresh
           </Button>
+          <Button icon={<KeyOutlined />} onClick={() => setKubeconfigOpen(true)}>
+            Get Kubeconfig
+          </Button>
           {cluster.status !== 'connected' && (
             <Button danger icon={<DeleteOutlined />} onClick={handleDelete}>
               Delete
@@ -348,6 +391,20 @@ export const ClusterDetailPage: React.FC = () => {
 
       {/* Tabs */}
       <Tabs items={tabItems} />
+
+      <ClusterKubeconfigModal
+        open={kubeconfigOpen}
+        clusterId={cluster.id}
+        clusterName={cluster.name}
+        onClose={() => setKubeconfigOpen(false)}
+      />
+
+      <NodeDrainModal
+        clusterId={cluster.id}
+        node={drainNode}
+        onClose={() => setDrainNode(undefined)}
+        onDrained={() => refetchNodes()}
+      />
     </div>
   )
 }
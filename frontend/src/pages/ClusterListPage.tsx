@@ -11,11 +11,14 @@ import {
   CheckCircleOutlined,
   CloseCircleOutlined,
   ExclamationCircleOutlined,
+  TagsOutlined,
 } from '@ant-design/icons'
 import type { ColumnsType } from 'antd/es/table'
 import { clusterApi } from '../api/cluster'
 import type { K8sCluster, ClusterStatus, ClusterType } from '../types/cluster'
 import { CreateClusterModal } from '../components/CreateClusterModal'
+import { ResourceTagList, TagEditorModal, TagSelectorInput, useResourceTags } from '../components/ResourceTags'
+import type { Tags } from '../types/tag'
 
 const { Option } = Select
 
@@ -27,10 +30,13 @@ export const ClusterListPage: React.FC = () => {
   const [statusFilter, setStatusFilter] = useState<string | undefined>()
   const [typeFilter, setTypeFilter] = useState<string | undefined>()
   const [providerFilter, setProviderFilter] = useState<string | undefined>()
+  const [tagFilter, setTagFilter] = useState<string | undefined>()
+  const [selectedIds, setSelectedIds] = useState<string[]>([])
+  const [tagEditor, setTagEditor] = useState<{ resources: { id: string; name: string }[]; tags?: Tags } | null>(null)
 
   // Fetch clusters
   const { data, isLoading, refetch } = useQuery({
-    queryKey: ['clusters', page, pageSize, statusFilter, typeFilter, providerFilter],
+    queryKey: ['clusters', page, pageSize, statusFilter, typeFilter, providerFilter, tagFilter],
     queryFn: () =>
       clusterApi.listClusters({
         page,
@@ -38,8 +44,11 @@ export const ClusterListPage: React.FC = () => {
         status: statusFilter,
         type: typeFilter,
         provider: providerFilter,
+        tags: tagFilter,
       }),
   })
+  const clusterIds = React.useMemo(() => (data?.clusters || []).map((c) => c.id), [data])
+  const { data: clusterTags, refetch: refetchTags } = useResourceTags('cluster', clusterIds)
 
   // Handle delete
   const handleDelete = async (clusterId: string) => {
@@ -145,6 +154,11 @@ export const ClusterListPage: React.FC = () => {
       key: 'region',
       width: 120,
     },
+    {
+      title: 'Tags',
+      key: 'tags',
+      render: (_, record) => <ResourceTagList tags={clusterTags?.[record.id]} />,
+    },
     {
       title: 'Last Connected',
       dataIndex: 'lastConnectedAt',
@@ -155,7 +169,7 @@ export const ClusterListPage: React.FC = () => {
     {
       title: 'Actions',
       key: 'actions',
-      width: 150,
+      width: 220,
       render: (_, record) => (
         <Space>
           <Button
@@ -166,6 +180,16 @@ export const ClusterListPage: React.FC = () => {
           >
             View
           </Button>
+          <Button
+            type="link"
+            size="small"
+            icon={<TagsOutlined />}
+            onClick={() =>
+              setTagEditor({ resources: [{ id: record.id, name: record.name }], tags: clusterTags?.[record.id] || {} })
+            }
+          >
+            Tags
+          </Button>
           <Popconfirm
             title="Delete this cluster?"
             description="This will disconnect and remove the cluster from the platform."
@@ -280,9 +304,30 @@ export const ClusterListPage: React.FC = () => {
           <Option value="alibaba">Alibaba</Option>
           <Option value="tencent">Tencent</Option>
         </Select>
+        <TagSelectorInput
+          resourceType="cluster"
+          value={tagFilter}
+          onChange={(selector) => {
+            setTagFilter(selector)
+            setPage(1)
+          }}
+        />
         <Button icon={<ReloadOutlined />} onClick={() => refetch()}>
           Refresh
         </Button>
+        <Button
+          icon={<TagsOutlined />}
+          disabled={selectedIds.length === 0}
+          onClick={() =>
+            setTagEditor({
+              resources: (data?.clusters || [])
+                .filter((c) => selectedIds.includes(c.id))
+                .map((c) => ({ id: c.id, name: c.name })),
+            })
+          }
+        >
+          Tag Selected{selectedIds.length > 0 ? ` (${selectedIds.length})` : ''}
+        </Button>
       </Space>
 
       {/* Table */}
@@ -291,6 +336,10 @@ export const ClusterListPage: React.FC = () => {
         dataSource={data?.clusters || []}
         rowKey="id"
         loading={isLoading}
+        rowSelection={{
+          selectedRowKeys: selectedIds,
+          onChange: (keys) => setSelectedIds(keys as string[]),
+        }}
         pagination={{
           current: page,
           pageSize: pageSize,
@@ -313,6 +362,21 @@ export const ClusterListPage: React.FC = () => {
           refetch()
         }}
       />
+
+      {/* Tag Editor */}
+      <TagEditorModal
+        open={tagEditor !== null}
+        resourceType="cluster"
+        resources={tagEditor?.resources || []}
+        tags={tagEditor?.tags}
+        onClose={() => setTagEditor(null)}
+        onSaved={() => {
+          setTagEditor(null)
+          setSelectedIds([])
+          refetchTags()
+          if (tagFilter) refetch()
+        }}
+      />
     </div>
   )
 }
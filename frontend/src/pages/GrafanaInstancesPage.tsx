@@ -33,7 +33,12 @@ import {
   ApiOutlined,
 } from '@ant-design/icons'
 import type { ColumnsType } from 'antd/es/table'
-import grafanaApi, { type GrafanaInstance, type CreateGrafanaInstanceRequest } from '../api/grafana'
+import grafanaApi, {
+  type GrafanaInstance,
+  type CreateGrafanaInstanceRequest,
+  type SyncGrafanaInstanceResponse,
+} from '../api/grafana'
+import { operationApi } from '../api/operation'
 
 const { Option } = Select
 
@@ -169,12 +174,18 @@ export const GrafanaInstancesPage: React.FC = () => {
   const handleSync = async (instance: GrafanaInstance) => {
     try {
       setSyncing({ ...syncing, [instance.id]: true })
-      const result = await grafanaApi.syncInstance(instance.id, {
+      const accepted = await grafanaApi.syncInstance(instance.id, {
         syncDashboards: true,
         syncDataSources: true,
         syncFolders: true,
       })
-      message.success(result.message)
+      queryClient.invalidateQueries({ queryKey: ['grafanaInstances'] })
+      const operation = await operationApi.wait<SyncGrafanaInstanceResponse>(accepted.operationId)
+      if (operation.status === 'succeeded') {
+        message.success(operation.result?.message || 'Sync completed')
+      } else {
+        message.error(`Sync failed: ${operation.error || operation.status}`)
+      }
       queryClient.invalidateQueries({ queryKey: ['grafanaInstances'] })
     } catch (error: any) {
       message.error(`Sync failed: ${error.response?.data?.message || error.message}`)
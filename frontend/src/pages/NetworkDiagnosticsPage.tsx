@@ -0,0 +1,584 @@
+import React, { useState } from 'react'
+import { useQuery, useMutation, useQueryClient } from '@tanstack/react-query'
+import {
+  Alert,
+  Button,
+  Card,
+  Col,
+  Descriptions,
+  Drawer,
+  Empty,
+  Form,
+  Input,
+  InputNumber,
+  Popconfirm,
+  Row,
+  Select,
+  Space,
+  Statistic,
+  Switch,
+  Table,
+  Tag,
+  Tooltip,
+  message,
+} from 'antd'
+import {
+  ApiOutlined,
+  DeleteOutlined,
+  EyeOutlined,
+  PlayCircleOutlined,
+  ReloadOutlined,
+} from '@ant-design/icons'
+import type { ColumnsType } from 'antd/es/table'
+import dayjs from 'dayjs'
+import { networkDiagnosticApi } from '../api/networkDiagnostic'
+import { operationApi } from '../api/operation'
+import { hostApi } from '../api/host'
+import type {
+  BandwidthResult,
+  DNSLookupResult,
+  DNSRecord,
+  NetworkDiagnostic,
+  NetworkDiagnosticListParams,
+  NetworkDiagnosticStatus,
+  NetworkDiagnosticType,
+  RunNetworkDiagnosticRequest,
+  TCPConnectAttempt,
+  TCPConnectResult,
+  TraceHop,
+  TraceResult,
+} from '../types/networkDiagnostic'
+
+const { Option } = Select
+
+const typeConfig: Record<NetworkDiagnosticType, { text: string; placeholder: string }> = {
+  dns: { text: 'DNS lookup', placeholder: 'api.example.com' },
+  traceroute: { text: 'Traceroute', placeholder: 'db.internal' },
+  mtr: { text: 'MTR', placeholder: 'db.internal' },
+  tcp: { text: 'TCP connect', placeholder: 'db.internal' },
+  bandwidth: { text: 'Bandwidth', placeholder: '' },
+}
+
+const statusConfig: Record<NetworkDiagnosticStatus, { color: string; text: string }> = {
+  running: { color: 'processing', text: 'Running' },
+  completed: { color: 'success', text: 'Completed' },
+  failed: { color: 'error', text: 'Failed' },
+}
+
+const formatBits = (bitsPerSecond: number) => {
+  const units = ['bit/s', 'Kbit/s', 'Mbit/s', 'Gbit/s']
+  let value = bitsPerSecond
+  let unit = 0
+  while (value >= 1000 && unit < units.length - 1) {
+    value /= 1000
+    unit++
+  }
+  return `${value.toFixed(unit === 0 ? 0 : 2)} ${units[unit]}`
+}
+
+const formatMs = (ms?: number) => (ms === undefined ? '-' : `${ms.toFixed(1)} ms`)
+
+const hopColumns: ColumnsType<TraceHop> = [
+  { title: 'Hop', dataIndex: 'hop', key: 'hop', width: 60 },
+  {
+    title: 'Host',
+    key: 'host',
+    render: (_: any, hop) =>
+      hop.address ? (
+        <Space direction="vertical" size={0}>
+          <span>{hop.address}</span>
+          {hop.hostname && <span style={{ color: '#999' }}>{hop.hostname}</span>}
+        </Space>
+      ) : (
+        <span style={{ color: '#999' }}>No reply</span>
+      ),
+  },
+  {
+    title: 'Loss',
+    dataIndex: 'loss',
+    key: 'loss',
+    render: (loss: number) => (
+      <span style={{ color: loss >= 50 ? '#cf1322' : loss > 0 ? '#faad14' : undefined }}>{loss.toFixed(1)}%</span>
+    ),
+  },
+  { title: 'Sent', dataIndex: 'sent', key: 'sent' },
+  { title: 'Last', dataIndex: 'last', key: 'last', render: formatMs },
+  { title: 'Avg', dataIndex: 'avg', key: 'avg', render: formatMs },
+  { title: 'Best', dataIndex: 'best', key: 'best', render: formatMs },
+  { title: 'Worst', dataIndex: 'worst', key: 'worst', render: formatMs },
+]
+
+// DiagnosticResult renders the result of a diagnostic by its type
+const DiagnosticResult: React.FC<{ diagnostic: NetworkDiagnostic }> = ({ diagnostic }) => {
+  if (diagnostic.status === 'failed') {
+    return <Alert type="error" showIcon message="The test could not be run" description={diagnostic.error} />
+  }
+  if (!diagnostic.result) {
+    return <Empty description={diagnostic.status === 'running' ? 'The test is running' : 'No result'} />
+  }
+
+  switch (diagnostic.type) {
+    case 'dns': {
+      const result = diagnostic.result as DNSLookupResult
+      return (
+        <>
+          {result.error && <Alert type="warning" showIcon message={result.error} style={{ marginBottom: 16 }} />}
+          <Descriptions column={3} size="small" style={{ marginBottom: 16 }}>
+            <Descriptions.Item label="Resolver">{result.server || "Host's resolver"}</Descriptions.Item>
+            <Descriptions.Item label="Record type">{result.recordType}</Descriptions.Item>
+            <Descriptions.Item label="Latency">{formatMs(result.latency)}</Descriptions.Item>
+          </Descriptions>
+          <Table<DNSRecord>
+            rowKey={(record) => `${record.type}-${record.value}`}
+            size="small"
+            pagination={false}
+            dataSource={result.records}
+            columns={[
+              { title: 'Type', dataIndex: 'type', key: 'type', width: 80 },
+              { title: 'Value', dataIndex: 'value', key: 'value' },
+            ]}
+          />
+          {result.trace && (
+            <Card title="dig +trace" size="small" style={{ marginTop: 16 }}>
+              <pre style={{ fontSize: 12, margin: 0, whiteSpace: 'pre-wrap' }}>{result.trace}</pre>
+            </Card>
+          )}
+        </>
+      )
+    }
+    case 'traceroute':
+    case 'mtr': {
+      const result = diagnostic.result as TraceResult
+      return (
+        <>
+          <Space style={{ marginBottom: 16 }}>
+            {result.reached ? <Tag color="success">Destination reached</Tag> : <Tag color="error">Destination not reached</Tag>}
+            <span>{result.hops.length} hops</span>
+          </Space>
+          <Table<TraceHop> rowKey="hop" size="small" pagination={false} dataSource={result.hops} columns={hopColumns} />
+          {result.output && (
+            <Card title="Output" size="small" style={{ marginTop: 16 }}>
+              <pre style={{ fontSize: 12, margin: 0, whiteSpace: 'pre-wrap' }}>{result.output}</pre>
+            </Card>
+          )}
+        </>
+      )
+    }
+    case 'tcp': {
+      const result = diagnostic.result as TCPConnectResult
+      return (
+        <>
+          <Row gutter={16} style={{ marginBottom: 16 }}>
+            <Col span={8}>
+              <Statistic
+                title="Connected"
+                value={`${result.succeeded}/${result.attempts.length}`}
+                valueStyle={{ color: result.succeeded === result.attempts.length ? '#3f8600' : '#cf1322' }}
+              />
+            </Col>
+            <Col span={16}>
+              <Statistic title="Address" value={result.address || '-'} />
+            </Col>
+          </Row>
+          <Table<TCPConnectAttempt>
+            rowKey={(_, index) => String(index)}
+            size="small"
+            pagination={false}
+            dataSource={result.attempts}
+            columns={[
+              { title: '#', key: 'index', width: 60, render: (_: any, __, index) => index + 1 },
+              {
+                title: 'Result',
+                key: 'result',
+                render: (_: any, attempt) =>
+                  attempt.error ? <Tag color="error">Failed</Tag> : <Tag color="success">Connected</Tag>,
+              },
+              { title: 'Latency', dataIndex: 'latency', key: 'latency', render: formatMs },
+              { title: 'Error', dataIndex: 'error', key: 'error', ellipsis: true },
+            ]}
+          />
+        </>
+      )
+    }
+    case 'bandwidth': {
+      const result = diagnostic.result as BandwidthResult
+      return (
+        <Row gutter={16}>
+          <Col span={8}>
+            <Statistic title="Throughput" value={formatBits(result.bitsPerSecond)} />
+          </Col>
+          <Col span={8}>
+            <Statistic title="Received" value={(result.bytes / 1e6).toFixed(1)} suffix="MB" />
+          </Col>
+          <Col span={8}>
+            <Statistic title="Duration" value={result.seconds.toFixed(1)} suffix="s" />
+          </Col>
+        </Row>
+      )
+    }
+  }
+  return null
+}
+
+export const NetworkDiagnosticsPage: React.FC = () => {
+  const queryClient = useQueryClient()
+  const [form] = Form.useForm()
+  const diagnosticType: NetworkDiagnosticType = Form.useWatch('type', form) || 'dns'
+  const [params, setParams] = useState<NetworkDiagnosticListParams>({ page: 1, pageSize: 20 })
+  const [selectedId, setSelectedId] = useState<string | null>(null)
+  const [running, setRunning] = useState(false)
+
+  const { data: hostsData } = useQuery({
+    queryKey: ['hosts', 'diagnostics'],
+    queryFn: () => hostApi.listHosts({ page: 1, pageSize: 100 }),
+  })
+  const hosts = hostsData?.hosts || []
+
+  const { data: diagnostics, isLoading, refetch } = useQuery({
+    queryKey: ['networkDiagnostics', params],
+    queryFn: () => networkDiagnosticApi.list(params),
+  })
+
+  const { data: selected, isLoading: selectedLoading } = useQuery({
+    queryKey: ['networkDiagnostic', selectedId],
+    queryFn: () => networkDiagnosticApi.get(selectedId!),
+    enabled: !!selectedId,
+    refetchInterval: (query) => (query.state.data?.status === 'running' ? 2000 : false),
+  })
+
+  const deleteMutation = useMutation({
+    mutationFn: networkDiagnosticApi.delete,
+    onSuccess: () => {
+      message.success('Diagnostic deleted successfully')
+      queryClient.invalidateQueries({ queryKey: ['networkDiagnostics'] })
+    },
+    onError: (error: any) => {
+      message.error(`Failed to delete diagnostic: ${error.response?.data?.message || error.message}`)
+    },
+  })
+
+  const handleRun = async (values: RunNetworkDiagnosticRequest) => {
+    try {
+      setRunning(true)
+      const accepted = await networkDiagnosticApi.run(values)
+      queryClient.invalidateQueries({ queryKey: ['networkDiagnostics'] })
+      const operation = await operationApi.wait<NetworkDiagnostic>(accepted.operationId)
+      if (operation.status === 'succeeded' && operation.result) {
+        setSelectedId(operation.result.id)
+      } else {
+        message.error(`Diagnostic failed: ${operation.error || operation.status}`)
+      }
+      queryClient.invalidateQueries({ queryKey: ['networkDiagnostics'] })
+    } catch (error: any) {
+      message.error(`Failed to run diagnostic: ${error.response?.data?.message || error.message}`)
+    } finally {
+      setRunning(false)
+    }
+  }
+
+  const columns: ColumnsType<NetworkDiagnostic> = [
+    {
+      title: 'Started',
+      dataIndex: 'startedAt',
+      key: 'startedAt',
+      render: (time: string) => dayjs(time).format('YYYY-MM-DD HH:mm:ss'),
+    },
+    {
+      title: 'Host',
+      dataIndex: 'hostName',
+      key: 'hostName',
+    },
+    {
+      title: 'Type',
+      dataIndex: 'type',
+      key: 'type',
+      render: (type: NetworkDiagnosticType) => <Tag>{typeConfig[type].text}</Tag>,
+    },
+    {
+      title: 'Target',
+      key: 'target',
+      ellipsis: true,
+      render: (_: any, diagnostic) =>
+        diagnostic.peerHostName ? `${diagnostic.peerHostName} (${diagnostic.target})` : diagnostic.target,
+    },
+    {
+      title: 'Status',
+      dataIndex: 'status',
+      key: 'status',
+      render: (status: NetworkDiagnosticStatus, diagnostic) => (
+        <Tooltip title={diagnostic.error}>
+          <Tag color={statusConfig[status].color}>{statusConfig[status].text}</Tag>
+        </Tooltip>
+      ),
+    },
+    {
+      title: 'Summary',
+      dataIndex: 'summary',
+      key: 'summary',
+      ellipsis: true,
+    },
+    {
+      title: 'Duration',
+      dataIndex: 'duration',
+      key: 'duration',
+      render: (duration: number, diagnostic) =>
+        diagnostic.status === 'running' ? '-' : `${(duration / 1000).toFixed(1)}s`,
+    },
+    {
+      title: 'Actions',
+      key: 'actions',
+      render: (_: any, diagnostic) => (
+        <Space>
+          <Tooltip title="Result">
+            <Button type="text" icon={<EyeOutlined />} onClick={() => setSelectedId(diagnostic.id)} />
+          </Tooltip>
+          <Popconfirm
+            title="Delete this diagnostic?"
+            disabled={diagnostic.status === 'running'}
+            onConfirm={() => deleteMutation.mutate(diagnostic.id)}
+          >
+            <Button type="text" danger icon={<DeleteOutlined />} disabled={diagnostic.status === 'running'} />
+          </Popconfirm>
+        </Space>
+      ),
+    },
+  ]
+
+  return (
+    <div style={{ padding: '24px' }}>
+      <div style={{ marginBottom: '24px', display: 'flex', justifyContent: 'space-between', alignItems: 'center' }}>
+        <span style={{ fontSize: '20px', fontWeight: 'bold' }}>
+          <ApiOutlined /> Network Diagnostics
+        </span>
+        <Button icon={<ReloadOutlined />} onClick={() => refetch()}>
+          Refresh
+        </Button>
+      </div>
+
+      {/* Run a test from a host's agent */}
+      <Card title="Run Diagnostic" style={{ marginBottom: '24px' }}>
+        <Form
+          form={form}
+          layout="vertical"
+          initialValues={{ type: 'dns', recordType: 'A' }}
+          onFinish={handleRun}
+        >
+          <Row gutter={16}>
+            <Col span={6}>
+              <Form.Item name="hostId" label="From Host" rules={[{ required: true, message: 'Please select a host' }]}>
+                <Select showSearch optionFilterProp="children" placeholder="Select host">
+                  {hosts.map((host) => (
+                    <Option key={host.id} value={host.id}>
+                      {host.hostname} ({host.ipAddress})
+                    </Option>
+                  ))}
+                </Select>
+              </Form.Item>
+            </Col>
+            <Col span={4}>
+              <Form.Item name="type" label="Test">
+                <Select>
+                  {(Object.keys(typeConfig) as NetworkDiagnosticType[]).map((type) => (
+                    <Option key={type} value={type}>
+                      {typeConfig[type].text}
+                    </Option>
+                  ))}
+                </Select>
+              </Form.Item>
+            </Col>
+            {diagnosticType === 'bandwidth' ? (
+              <Col span={6}>
+                <Form.Item
+                  name="peerHostId"
+                  label="To Host"
+                  rules={[{ required: true, message: 'Please select the receiving host' }]}
+                >
+                  <Select showSearch optionFilterProp="children" placeholder="Select host">
+                    {hosts.map((host) => (
+                      <Option key={host.id} value={host.id}>
+                        {host.hostname} ({host.ipAddress})
+                      </Option>
+                    ))}
+                  </Select>
+                </Form.Item>
+              </Col>
+            ) : (
+              <Col span={6}>
+                <Form.Item name="target" label="Target" rules={[{ required: true, message: 'Please enter a target' }]}>
+                  <Input placeholder={typeConfig[diagnosticType].placeholder} />
+                </Form.Item>
+              </Col>
+            )}
+
+            {diagnosticType === 'dns' && (
+              <>
+                <Col span={3}>
+                  <Form.Item name="recordType" label="Record">
+                    <Select>
+                      {['A', 'AAAA', 'CNAME', 'MX', 'NS', 'TXT', 'PTR'].map((type) => (
+                        <Option key={type} value={type}>
+                          {type}
+                        </Option>
+                      ))}
+                    </Select>
+                  </Form.Item>
+                </Col>
+                <Col span={3}>
+                  <Form.Item name="server" label="Resolver" tooltip="The host's resolver when empty">
+                    <Input placeholder="8.8.8.8" />
+                  </Form.Item>
+                </Col>
+                <Col span={2}>
+                  <Form.Item name="trace" label="Trace" valuePropName="checked" tooltip="dig +trace from the root">
+                    <Switch />
+                  </Form.Item>
+                </Col>
+              </>
+            )}
+            {(diagnosticType === 'traceroute' || diagnosticType === 'mtr') && (
+              <Col span={3}>
+                <Form.Item name="maxHops" label="Max Hops">
+                  <InputNumber min={1} max={64} placeholder="30" style={{ width: '100%' }} />
+                </Form.Item>
+              </Col>
+            )}
+            {diagnosticType === 'mtr' && (
+              <Col span={3}>
+                <Form.Item name="count" label="Cycles">
+                  <InputNumber min={1} max={100} placeholder="10" style={{ width: '100%' }} />
+                </Form.Item>
+              </Col>
+            )}
+            {diagnosticType === 'tcp' && (
+              <>
+                <Col span={3}>
+                  <Form.Item name="port" label="Port" rules={[{ required: true, message: 'Please enter a port' }]}>
+                    <InputNumber min={1} max={65535} style={{ width: '100%' }} />
+                  </Form.Item>
+                </Col>
+                <Col span={3}>
+                  <Form.Item name="count" label="Attempts">
+                    <InputNumber min={1} max={20} placeholder="3" style={{ width: '100%' }} />
+                  </Form.Item>
+                </Col>
+              </>
+            )}
+            {diagnosticType === 'bandwidth' && (
+              <>
+                <Col span={3}>
+                  <Form.Item name="duration" label="Seconds">
+                    <InputNumber min={1} max={60} placeholder="10" style={{ width: '100%' }} />
+                  </Form.Item>
+                </Col>
+                <Col span={3}>
+                  <Form.Item name="port" label="Port" tooltip="Where the receiving agent listens">
+                    <InputNumber min={1} max={65535} placeholder="5201" style={{ width: '100%' }} />
+                  </Form.Item>
+                </Col>
+              </>
+            )}
+          </Row>
+          <Button type="primary" htmlType="submit" icon={<PlayCircleOutlined />} loading={running}>
+            Run
+          </Button>
+        </Form>
+      </Card>
+
+      {/* History */}
+      <Card title="History">
+        <Space style={{ marginBottom: 16 }} wrap>
+          <Select
+            allowClear
+            showSearch
+            optionFilterProp="children"
+            placeholder="Host"
+            style={{ width: 220 }}
+            onChange={(hostId) => setParams({ ...params, hostId, page: 1 })}
+          >
+            {hosts.map((host) => (
+              <Option key={host.id} value={host.id}>
+                {host.hostname}
+              </Option>
+            ))}
+          </Select>
+          <Select
+            allowClear
+            placeholder="Test"
+            style={{ width: 150 }}
+            onChange={(type) => setParams({ ...params, type, page: 1 })}
+          >
+            {(Object.keys(typeConfig) as NetworkDiagnosticType[]).map((type) => (
+              <Option key={type} value={type}>
+                {typeConfig[type].text}
+              </Option>
+            ))}
+          </Select>
+          <Select
+            allowClear
+            placeholder="Status"
+            style={{ width: 130 }}
+            onChange={(status) => setParams({ ...params, status, page: 1 })}
+          >
+            {(Object.keys(statusConfig) as NetworkDiagnosticStatus[]).map((status) => (
+              <Option key={status} value={status}>
+                {statusConfig[status].text}
+              </Option>
+            ))}
+          </Select>
+          <Input.Search
+            allowClear
+            placeholder="Search target"
+            style={{ width: 220 }}
+            onSearch={(search) => setParams({ ...params, search: search || undefined, page: 1 })}
+          />
+        </Space>
+        <Table
+          rowKey="id"
+          columns={columns}
+          dataSource={diagnostics?.data || []}
+          loading={isLoading}
+          pagination={{
+            current: params.page,
+            pageSize: params.pageSize,
+            total: diagnostics?.total || 0,
+            showTotal: (total) => `Total ${total} diagnostics`,
+            onChange: (page, pageSize) => setParams({ ...params, page, pageSize }),
+          }}
+        />
+      </Card>
+
+      {/* Result of a diagnostic */}
+      <Drawer
+        title={selected ? `${typeConfig[selected.type].text} from ${selected.hostName}` : ''}
+        open={!!selectedId}
+        onClose={() => setSelectedId(null)}
+        width={800}
+      >
+        {selectedLoading || !selected ? null : (
+          <>
+            <Descriptions column={2} size="small" style={{ marginBottom: 16 }}>
+              <Descriptions.Item label="Target">
+                {selected.peerHostName ? `${selected.peerHostName} (${selected.target})` : selected.target}
+              </Descriptions.Item>
+              <Descriptions.Item label="Status">
+                <Tag color={statusConfig[selected.status].color}>{statusConfig[selected.status].text}</Tag>
+              </Descriptions.Item>
+              <Descriptions.Item label="Started">
+                {dayjs(selected.startedAt).format('YYYY-MM-DD HH:mm:ss')}
+              </Descriptions.Item>
+              <Descriptions.Item label="Duration">
+                {selected.status === 'running' ? '-' : `${(selected.duration / 1000).toFixed(1)}s`}
+              </Descriptions.Item>
+              {selected.summary && (
+                <Descriptions.Item label="Summary" span={2}>
+                  {selected.summary}
+                </Descriptions.Item>
+              )}
+            </Descriptions>
+            <DiagnosticResult diagnostic={selected} />
+          </>
+        )}
+      </Drawer>
+    </div>
+  )
+}
@@ -1,10 +1,30 @@
-import React, { useState } from 'react'
-import { useQuery, useMutation, useQueryClient } from '@tanstack/react-query'
-import { Button, Space, List, Tag, Card, Badge, Drawer, Switch, Form, Select, Empty, Popconfirm } from 'antd'
+import React, { useEffect, useRef, useState } from 'react'
+import { useQuery, useInfiniteQuery, useMutation, useQueryClient } from '@tanstack/react-query'
+import {
+  Button,
+  Space,
+  List,
+  Tag,
+  Card,
+  Badge,
+  Drawer,
+  Switch,
+  Form,
+  Select,
+  Empty,
+  Popconfirm,
+  Input,
+  InputNumber,
+  Divider,
+  Checkbox,
+  Segmented,
+} from 'antd'
 import {
   BellOutlined,
   DeleteOutlined,
   CheckOutlined,
+  InboxOutlined,
+  UndoOutlined,
   EyeOutlined,
   SettingOutlined,
   ReloadOutlined,
@@ -16,29 +36,93 @@ import {
 import dayjs from 'dayjs'
 import relativeTime from 'dayjs/plugin/relativeTime'
 import { notificationApi } from '../api/notification'
-import type { NotificationType, NotificationPriority } from '../types/notification'
+import { useAuthStore } from '../store/authStore'
+import type {
+  NotificationType,
+  NotificationPriority,
+  NotificationPreference,
+  NotificationSource,
+  NotificationAction,
+} from '../types/notification'
 
 dayjs.extend(relativeTime)
 
 const { Option } = Select
 
+const sourceLabels: Record<NotificationSource, string> = {
+  alerts: 'Alerts',
+  batch_tasks: 'Batch Tasks',
+  ai: 'AI',
+  hosts: 'Hosts',
+  clusters: 'Clusters',
+  system: 'System',
+  reports: 'Reports',
+  certificates: 'Certificates',
+}
+
 export const NotificationCenterPage: React.FC = () => {
   const queryClient = useQueryClient()
   const [settingsVisible, setSettingsVisible] = useState(false)
   const [form] = Form.useForm()
+  const [search, setSearch] = useState('')
+  const [sources, setSources] = useState<NotificationSource[]>([])
+  const [readFilter, setReadFilter] = useState<'all' | 'unread' | 'read'>('all')
+  const [archived, setArchived] = useState(false)
+  const [selected, setSelected] = useState<string[]>([])
+  const sentinel = useRef<HTMLDivElement>(null)
 
-  // Fetch notifications
-  const { data: notificationsData, isLoading } = useQuery({
-    queryKey: ['notifications'],
-    queryFn: () => notificationApi.getNotifications({ limit: 50 }),
-    refetchInterval: 30000, // Refresh every 30 seconds
+  // Fetch notifications a page at a time as the list is scrolled
+  const {
+    data: notificationsData,
+    isLoading,
+    fetchNextPage,
+    hasNextPage,
+    isFetchingNextPage,
+  } = useInfiniteQuery({
+    queryKey: ['notifications', search, sources, readFilter, archived],
+    queryFn: ({ pageParam }) =>
+      notificationApi.searchNotifications({
+        q: search,
+        sources,
+        read: readFilter === 'all' ? undefined : readFilter === 'read',
+        archived,
+        cursor: pageParam,
+        limit: 30,
+      }),
+    initialPageParam: undefined as string | undefined,
+    getNextPageParam: (lastPage) => lastPage.data.nextCursor || undefined,
   })
 
+  // Load the next page when the end of the list scrolls into view
+  useEffect(() => {
+    const node = sentinel.current
+    if (!node || !hasNextPage) return
+    const observer = new IntersectionObserver((entries) => {
+      if (entries[0].isIntersecting && !isFetchingNextPage) fetchNextPage()
+    })
+    observer.observe(node)
+    return () => observer.disconnect()
+  }, [hasNextPage, isFetchingNextPage, fetchNextPage])
+
+  // Follow deliveries and read state changes made in other sessions
+  useEffect(() => {
+    const token = useAuthStore.getState().accessToken || ''
+    // Browsers cannot set headers on websockets; the token rides in the subprotocol
+    const ws = new WebSocket(notificationApi.changesUrl(), ['bearer', token])
+    ws.onmessage = (message) => {
+      const msg = JSON.parse(message.data)
+      if (msg.type !== 'event' && msg.type !== 'dropped') return
+      queryClient.invalidateQueries({ queryKey: ['notifications'] })
+      queryClient.invalidateQueries({ queryKey: ['unreadCount'] })
+      queryClient.invalidateQueries({ queryKey: ['notificationStats'] })
+    }
+    return () => ws.close()
+  }, [queryClient])
+
   // Fetch unread count
   const { data: unreadData } = useQuery({
     queryKey: ['unreadCount'],
     queryFn: () => notificationApi.getUnreadCount(),
-    refetchInterval: 15000, // Refresh every 15 seconds
   })
 
   // Fetch notification stats
@@ -73,6 +157,23 @@ export const NotificationCenterPage: React.FC = () => {
     },
   })
 
+  // Bulk action mutation
+  const bulkMutation = useMutation({
+    mutationFn: ({ action, ids }: { action: NotificationAction; ids: string[] }) =>
+      notificationApi.bulkUpdate(action, ids),
+    onSuccess: () => {
+      setSelected([])
+      queryClient.invalidateQueries({ queryKey: ['notifications'] })
+      queryClient.invalidateQueries({ queryKey: ['unreadCount'] })
+      queryClient.invalidateQueries({ queryKey: ['notificationStats'] })
+    },
+  })
+
+  // Preview what the settings in the form would digest
+  const previewMutation = useMutation({
+    mutationFn: (values: Partial<NotificationPreference>) => notificationApi.previewNotificationPreference(values),
+  })
+
   // Delete notification mutation
   const deleteNotificationMutation = useMutation({
     mutationFn: (id: string) => notificationApi.deleteNotification(id),
@@ -83,10 +184,11 @@ export const NotificationCenterPage: React.FC = () => {
     },
   })
 
-  const notifications = notificationsData?.data.notifications || []
+  const notifications = notificationsData?.pages.flatMap((page) => page.data.notifications) || []
   const unreadCount = unreadData?.data.unreadCount || 0
   const stats = statsData?.data
   const preference = prefData?.data
+  const preview = previewMutation.data?.data
 
   // Get icon and color for notification type
   const getTypeConfig = (type: NotificationType) => {
@@ -138,6 +240,15 @@ export const NotificationCenterPage: React.FC = () => {
     deleteNotificationMutation.mutate(id)
   }
 
+  // Handle bulk action on the selected notifications
+  const handleBulk = (action: NotificationAction) => {
+    if (selected.length > 0) bulkMutation.mutate({ action, ids: selected })
+  }
+
+  const toggleSelected = (id: string, checked: boolean) => {
+    setSelected((current) => (checked ? [...current, id] : current.filter((s) => s !== id)))
+  }
+
   // Handle update preferences
   const handleUpdatePreferences = async (values: any) => {
     try {
@@ -205,6 +316,89 @@ export const NotificationCenterPage: React.FC = () => {
         </div>
       )}
 
+      {/* Search and bulk actions */}
+      <Card size="small" style={{ marginBottom: '16px' }}>
+        <Space wrap style={{ width: '100%', justifyContent: 'space-between' }}>
+          <Space wrap>
+            <Input.Search
+              placeholder="Search title and message"
+              allowClear
+              onSearch={(value) => setSearch(value.trim())}
+              style={{ width: 260 }}
+            />
+            <Select
+              mode="multiple"
+              placeholder="All sources"
+              value={sources}
+              onChange={setSources}
+              style={{ minWidth: 200 }}
+              allowClear
+            >
+              {(Object.keys(sourceLabels) as NotificationSource[]).map((source) => (
+                <Option key={source} value={source}>
+                  {sourceLabels[source]}
+                </Option>
+              ))}
+            </Select>
+            <Segmented
+              value={readFilter}
+              onChange={(value) => setReadFilter(value as 'all' | 'unread' | 'read')}
+              options={[
+                { label: 'All', value: 'all' },
+                { label: 'Unread', value: 'unread' },
+                { label: 'Read', value: 'read' },
+              ]}
+            />
+            <Segmented
+              value={archived ? 'archived' : 'inbox'}
+              onChange={(value) => {
+                setArchived(value === 'archived')
+                setSelected([])
+              }}
+              options={[
+                { label: 'Inbox', value: 'inbox' },
+                { label: 'Archived', value: 'archived' },
+              ]}
+            />
+          </Space>
+          <Space wrap>
+            <Checkbox
+              checked={notifications.length > 0 && selected.length === notifications.length}
+              indeterminate={selected.length > 0 && selected.length < notifications.length}
+              onChange={(e) => setSelected(e.target.checked ? notifications.map((n) => n.id) : [])}
+            >
+              {selected.length > 0 ? `${selected.length} selected` : 'Select all'}
+            </Checkbox>
+            <Button size="small" disabled={!selected.length} onClick={() => handleBulk('read')}>
+              Mark Read
+            </Button>
+            <Button size="small" disabled={!selected.length} onClick={() => handleBulk('unread')}>
+              Mark Unread
+            </Button>
+            {archived ? (
+              <Button size="small" icon={<UndoOutlined />} disabled={!selected.length} onClick={() => handleBulk('unarchive')}>
+                Restore
+              </Button>
+            ) : (
+              <Button size="small" icon={<InboxOutlined />} disabled={!selected.length} onClick={() => handleBulk('archive')}>
+                Archive
+              </Button>
+            )}
+            <Popconfirm
+              title={`Delete ${selected.length} notifications?`}
+              onConfirm={() => handleBulk('delete')}
+              okText="Yes"
+              cancelText="No"
+              disabled={!selected.length}
+            >
+              <Button size="small" danger icon={<DeleteOutlined />} disabled={!selected.length} loading={bulkMutation.isPending}>
+                Delete
+              </Button>
+            </Popconfirm>
+          </Space>
+        </Space>
+      </Card>
+
       {/* Notifications List */}
       <Card>
         {isLoading ? (
@@ -255,6 +449,11 @@ export const NotificationCenterPage: React.FC = () => {
                     </Popconfirm>,
                   ]}
                 >
+                  <Checkbox
+                    checked={selected.includes(item.id)}
+                    onChange={(e) => toggleSelected(item.id, e.target.checked)}
+                    style={{ marginRight: '12px' }}
+                  />
                   <List.Item.Meta
                     avatar={
                       <div
@@ -276,6 +475,7 @@ export const NotificationCenterPage: React.FC = () => {
                       <Space>
                         <span style={{ fontWeight: item.read ? 'normal' : 'bold' }}>{item.title}</span>
                         {getPriorityTag(item.priority)}
+                        {item.source && <Tag>{sourceLabels[item.source] || item.source}</Tag>}
                       </Space>
                     }
                     description={
@@ -292,6 +492,9 @@ export const NotificationCenterPage: React.FC = () => {
             }}
           />
         )}
+        <div ref={sentinel} style={{ textAlign: 'center', padding: hasNextPage ? '12px' : 0 }}>
+          {isFetchingNextPage && 'Loading more...'}
+        </div>
       </Card>
 
       {/* Settings Drawer */}
@@ -329,13 +532,94 @@ export const NotificationCenterPage: React.FC = () => {
               </Select>
             </Form.Item>
 
+            <Divider>Digests and Quiet Hours</Divider>
+
+            <Form.Item label="Web Digest" name="webDigest">
+              <Select>
+                <Option value="off">Off</Option>
+                <Option value="hourly">Hourly</Option>
+                <Option value="daily">Daily</Option>
+              </Select>
+            </Form.Item>
+
+            <Form.Item label="Email Digest" name="emailDigest">
+              <Select>
+                <Option value="off">Off</Option>
+                <Option value="hourly">Hourly</Option>
+                <Option value="daily">Daily</Option>
+              </Select>
+            </Form.Item>
+
+            <Form.Item label="Daily Digest Hour" name="digestHour">
+              <InputNumber min={0} max={23} style={{ width: '100%' }} />
+            </Form.Item>
+
+            <Form.Item
+              label="Always Deliver At Once From"
+              name="immediatePriority"
+              extra="Notifications of this priority or higher skip digests and quiet hours"
+            >
+              <Select>
+                <Option value="low">Low</Option>
+                <Option value="medium">Medium</Option>
+                <Option value="high">High</Option>
+                <Option value="critical">Critical</Option>
+              </Select>
+            </Form.Item>
+
+            <Space style={{ display: 'flex' }} align="baseline">
+              <Form.Item label="Quiet Hours Start" name="quietHoursStart">
+                <Input placeholder="22:00" />
+              </Form.Item>
+              <Form.Item label="Quiet Hours End" name="quietHoursEnd">
+                <Input placeholder="07:00" />
+              </Form.Item>
+            </Space>
+
+            <Form.Item label="Timezone" name="timezone">
+              <Input placeholder="UTC" />
+            </Form.Item>
+
             <Form.Item>
-              <Button type="primary" htmlType="submit" block>
-                Save Settings
-              </Button>
+              <Space direction="vertical" style={{ width: '100%' }}>
+                <Button
+                  block
+                  onClick={() => previewMutation.mutate(form.getFieldsValue())}
+                  loading={previewMutation.isPending}
+                >
+                  Preview Last 24 Hours
+                </Button>
+                <Button type="primary" htmlType="submit" block>
+                  Save Settings
+                </Button>
+              </Space>
             </Form.Item>
           </Form>
         )}
+
+        {preview && (
+          <Card size="small" title="Preview">
+            {(['web', 'email'] as const).map((channel) => {
+              const counts = preview.channels[channel]
+              return (
+                <div key={channel} style={{ marginBottom: '8px' }}>
+                  <Space wrap>
+                    <strong>{channel === 'web' ? 'Web' : 'Email'}</strong>
+                    <Tag color="red">{counts.immediate} at once</Tag>
+                    <Tag color="blue">{counts.digested} digested</Tag>
+                    <Tag color="purple">{counts.quietHours} held for quiet hours</Tag>
+                    <Tag>{counts.skipped} skipped</Tag>
+                  </Space>
+                  {counts.nextDigestAt && (
+                    <div style={{ color: '#8c8c8c', fontSize: '12px' }}>
+                      Next {counts.mode} digest {dayjs(counts.nextDigestAt).format('YYYY-MM-DD HH:mm')}
+                    </div>
+                  )}
+                </div>
+              )
+            })}
+          </Card>
+        )}
       </Drawer>
     </div>
   )
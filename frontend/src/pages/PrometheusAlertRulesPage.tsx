@@ -19,6 +19,7 @@ import {
   Row,
   Col,
   Statistic,
+  Alert,
 } from 'antd'
 import {
   PlusOutlined,
@@ -30,9 +31,14 @@ import {
   FireOutlined,
   InfoCircleOutlined,
   WarningOutlined,
+  EyeOutlined,
 } from '@ant-design/icons'
 import type { ColumnsType } from 'antd/es/table'
-import prometheusApi, { type PrometheusAlertRule, type CreatePrometheusAlertRuleRequest } from '../api/prometheus'
+import prometheusApi, {
+  type PrometheusAlertRule,
+  type CreatePrometheusAlertRuleRequest,
+  type PrometheusAlertRulePreview,
+} from '../api/prometheus'
 
 const { Option } = Select
 const { TextArea } = Input
@@ -42,6 +48,7 @@ export const PrometheusAlertRulesPage: React.FC = () => {
 
   const [isModalOpen, setIsModalOpen] = useState(false)
   const [editingRule, setEditingRule] = useState<PrometheusAlertRule | null>(null)
+  const [preview, setPreview] = useState<PrometheusAlertRulePreview | null>(null)
   const [form] = Form.useForm()
 
   // Fetch alert rules
@@ -101,9 +108,25 @@ export const PrometheusAlertRulesPage: React.FC = () => {
     },
   })
 
+  // Preview mutation: evaluates the expression now against the selected data source
+  const previewMutation = useMutation({
+    mutationFn: prometheusApi.previewAlertRule,
+    onSuccess: (result) => setPreview(result),
+    onError: (error: any) => {
+      setPreview(null)
+      message.error(`Failed to preview alert rule: ${error.response?.data?.message || error.message}`)
+    },
+  })
+
+  const handlePreview = async () => {
+    const values = await form.validateFields(['dataSourceId', 'expression'])
+    previewMutation.mutate({ dataSourceId: values.dataSourceId, expression: values.expression })
+  }
+
   // Handle add
   const handleAdd = () => {
     setEditingRule(null)
+    setPreview(null)
     form.resetFields()
     form.setFieldsValue({
       duration: 300,
@@ -116,6 +139,7 @@ export const PrometheusAlertRulesPage: React.FC = () => {
   // Handle edit
   const handleEdit = (rule: PrometheusAlertRule) => {
     setEditingRule(rule)
+    setPreview(null)
     form.setFieldsValue({
       dataSourceId: rule.dataSourceId,
       clusterId: rule.clusterId,
@@ -394,6 +418,36 @@ export const PrometheusAlertRulesPage: React.FC = () => {
             />
           </Form.Item>
 
+          <Form.Item>
+            <Button icon={<EyeOutlined />} onClick={handlePreview} loading={previewMutation.isPending}>
+              Preview
+            </Button>
+          </Form.Item>
+
+          {preview && (
+            <Alert
+              style={{ marginBottom: 16 }}
+              type={preview.warnings?.length ? 'warning' : preview.series.length ? 'error' : 'success'}
+              message={
+                preview.series.length
+                  ? `${preview.series.length} series match now and would fire after the duration (${preview.duration}ms)`
+                  : `No series match now (${preview.duration}ms)`
+              }
+              description={
+                <Space direction="vertical" size="small">
+                  {preview.series.slice(0, 20).map((series, i) => (
+                    <span key={i} style={{ fontFamily: 'monospace', fontSize: '12px' }}>
+                      {JSON.stringify(series.metric)} = {series.value?.value}
+                    </span>
+                  ))}
+                  {preview.warnings?.map((warning, i) => (
+                    <Tag key={`warning-${i}`} color="warning">{warning}</Tag>
+                  ))}
+                </Space>
+              }
+            />
+          )}
+
           <Row gutter={16}>
             <Col span={12}>
               <Form.Item
@@ -42,6 +42,8 @@ export const PrometheusDataSourcePage: React.FC = () => {
   const [testing, setTesting] = useState(false)
   const [testResult, setTestResult] = useState<{ success: boolean; message: string } | null>(null)
   const [form] = Form.useForm()
+  const flavor = Form.useWatch('flavor', form)
+  const isVirtual = flavor === 'virtual'
 
   // Fetch data sources
   const { data: dataSourcesData, isLoading, refetch } = useQuery({
@@ -50,6 +52,9 @@ export const PrometheusDataSourcePage: React.FC = () => {
   })
 
   const dataSources = dataSourcesData?.data || []
+  const memberOptions = dataSources.filter(
+    ds => ds.flavor !== 'virtual' && ds.id !== editingDataSource?.id
+  )
 
   // Create mutation
   const createMutation = useMutation({
@@ -101,6 +106,7 @@ export const PrometheusDataSourcePage: React.FC = () => {
     setTestResult(null)
     form.resetFields()
     form.setFieldsValue({
+      flavor: 'prometheus',
       insecureSkipTLS: false,
     })
     setIsModalOpen(true)
@@ -113,6 +119,8 @@ export const PrometheusDataSourcePage: React.FC = () => {
     form.setFieldsValue({
       clusterId: dataSource.clusterId,
       name: dataSource.name,
+      flavor: dataSource.flavor || 'prometheus',
+      memberIds: dataSource.memberIds,
       url: dataSource.url,
       username: dataSource.username,
       insecureSkipTLS: dataSource.insecureSkipTLS,
@@ -131,12 +139,31 @@ export const PrometheusDataSourcePage: React.FC = () => {
     try {
       setTesting(true)
       setTestResult(null)
-      const values = await form.validateFields(['url', 'username', 'password', 'insecureSkipTLS'])
+      if (isVirtual) {
+        const values = await form.validateFields(['memberIds'])
+        const result = await prometheusApi.testDataSource({
+          url: '',
+          flavor: 'virtual',
+          memberIds: values.memberIds,
+        })
+        setTestResult({
+          success: result.success,
+          message: result.error ? `${result.message} (${result.error})` : result.message,
+        })
+        if (!result.success) {
+          message.error(result.message)
+        } else {
+          message.success('Connection test successful')
+        }
+        return
+      }
+      const values = await form.validateFields(['url', 'username', 'password', 'insecureSkipTLS', 'flavor'])
       const result = await prometheusApi.testDataSource({
         url: values.url,
         username: values.username,
         password: values.password,
         insecureSkipTLS: values.insecureSkipTLS,
+        flavor: values.flavor,
       })
       setTestResult({
         success: result.success,
@@ -198,9 +225,14 @@ export const PrometheusDataSourcePage: React.FC = () => {
       dataIndex: 'url',
       key: 'url',
       ellipsis: true,
-      render: (url: string) => (
-        <span style={{ fontFamily: 'monospace', fontSize: '12px' }}>{url}</span>
-      ),
+      render: (url: string, record: PrometheusDataSource) =>
+        record.flavor === 'virtual' ? (
+          <Tag color="purple">
+            Virtual: {record.memberIds?.length || 0} data sources
+          </Tag>
+        ) : (
+          <span style={{ fontFamily: 'monospace', fontSize: '12px' }}>{url}</span>
+        ),
     },
     {
       title: 'Cluster',
@@ -370,29 +402,56 @@ export const PrometheusDataSourcePage: React.FC = () => {
             <Input placeholder="e.g., Production Prometheus" />
           </Form.Item>
 
-          <Form.Item
-            label="URL"
-            name="url"
-            rules={[{ required: true, message: 'Please enter the Prometheus URL' }]}
-          >
-            <Input placeholder="e.g., http://prometheus:9090" />
+          <Form.Item label="Type" name="flavor">
+            <Select>
+              <Option value="prometheus">Prometheus</Option>
+              <Option value="thanos">Thanos</Option>
+              <Option value="victoriametrics">VictoriaMetrics</Option>
+              <Option value="mimir">Mimir</Option>
+              <Option value="virtual">Virtual (query several data sources)</Option>
+            </Select>
           </Form.Item>
 
-          <Form.Item label="Username (Optional)" name="username">
-            <Input placeholder="Basic auth username" />
-          </Form.Item>
+          {isVirtual ? (
+            <Form.Item
+              label="Member Data Sources"
+              name="memberIds"
+              extra="Queries run against every member; each series gets a source label naming its member"
+              rules={[{ required: true, message: 'Please select at least one data source' }]}
+            >
+              <Select mode="multiple" placeholder="Select data sources">
+                {memberOptions.map(ds => (
+                  <Option key={ds.id} value={ds.id}>{ds.name}</Option>
+                ))}
+              </Select>
+            </Form.Item>
+          ) : (
+            <>
+              <Form.Item
+                label="URL"
+                name="url"
+                rules={[{ required: true, message: 'Please enter the Prometheus URL' }]}
+              >
+                <Input placeholder="e.g., http://prometheus:9090" />
+              </Form.Item>
 
-          <Form.Item label="Password (Optional)" name="password">
-            <Input.Password placeholder="Basic auth password" />
-          </Form.Item>
+              <Form.Item label="Username (Optional)" name="username">
+                <Input placeholder="Basic auth username" />
+              </Form.Item>
 
-          <Form.Item
-            label="Skip TLS Verification"
-            name="insecureSkipTLS"
-            valuePropName="checked"
-          >
-            <Switch />
-          </Form.Item>
+              <Form.Item label="Password (Optional)" name="password">
+                <Input.Password placeholder="Basic auth password" />
+              </Form.Item>
+
+              <Form.Item
+                label="Skip TLS Verification"
+                name="insecureSkipTLS"
+                valuePropName="checked"
+              >
+                <Switch />
+              </Form.Item>
+            </>
+          )}
 
           {editingDataSource && (
             <Form.Item
@@ -421,7 +480,7 @@ export const PrometheusDataSourcePage: React.FC = () => {
               <Button
                 onClick={handleTest}
                 loading={testing}
-                disabled={!form.getFieldValue('url')}
+                disabled={isVirtual ? !form.getFieldValue('memberIds')?.length : !form.getFieldValue('url')}
               >
                 Test Connection
               </Button>
@@ -0,0 +1,427 @@
+import React, { useState } from 'react'
+import { useQuery, useMutation, useQueryClient } from '@tanstack/react-query'
+import {
+  Button,
+  Card,
+  Col,
+  Drawer,
+  Empty,
+  Form,
+  Input,
+  InputNumber,
+  Modal,
+  Popconfirm,
+  Progress,
+  Row,
+  Select,
+  Space,
+  Statistic,
+  Switch,
+  Table,
+  Tag,
+  Tooltip,
+  message,
+} from 'antd'
+import {
+  AimOutlined,
+  DeleteOutlined,
+  EditOutlined,
+  LineChartOutlined,
+  PlusOutlined,
+  ReloadOutlined,
+  SyncOutlined,
+} from '@ant-design/icons'
+import type { ColumnsType } from 'antd/es/table'
+import { Line } from '@ant-design/plots'
+import dayjs from 'dayjs'
+import { sloApi } from '../api/slo'
+import prometheusApi from '../api/prometheus'
+import type { CreateSLORequest, SLO, SLOBurnRateAlert, SLOStatus } from '../types/slo'
+
+const { Option } = Select
+const { TextArea } = Input
+
+const statusConfig: Record<SLOStatus, { color: string; text: string }> = {
+  met: { color: 'success', text: 'Met' },
+  at_risk: { color: 'warning', text: 'At Risk' },
+  breached: { color: 'error', text: 'Breached' },
+  unknown: { color: 'default', text: 'Unknown' },
+}
+
+const windowOptions = [
+  { value: 7 * 86400, label: '7 days' },
+  { value: 28 * 86400, label: '28 days' },
+  { value: 30 * 86400, label: '30 days' },
+  { value: 90 * 86400, label: '90 days' },
+]
+
+// formatWindow formats seconds in the largest whole unit, e.g. 30d or 5m
+const formatWindow = (seconds: number) => {
+  if (seconds % 86400 === 0) return `${seconds / 86400}d`
+  if (seconds % 3600 === 0) return `${seconds / 3600}h`
+  if (seconds % 60 === 0) return `${seconds / 60}m`
+  return `${seconds}s`
+}
+
+const budgetColor = (remaining?: number) => {
+  if (remaining === undefined) return '#d9d9d9'
+  if (remaining <= 0) return '#ff4d4f'
+  if (remaining < 25) return '#faad14'
+  return '#52c41a'
+}
+
+export const SLOPage: React.FC = () => {
+  const queryClient = useQueryClient()
+  const [isModalOpen, setIsModalOpen] = useState(false)
+  const [editingSLO, setEditingSLO] = useState<SLO | null>(null)
+  const [selectedSLO, setSelectedSLO] = useState<SLO | null>(null)
+  const [form] = Form.useForm()
+
+  const { data: slos = [], isLoading, refetch } = useQuery({
+    queryKey: ['slos'],
+    queryFn: () => sloApi.list(),
+    refetchInterval: 60000, // SLOs are evaluated every minute
+  })
+
+  const { data: dataSourcesData } = useQuery({
+    queryKey: ['prometheusDataSources'],
+    queryFn: () => prometheusApi.getDataSources({ page: 1, pageSize: 100 }),
+  })
+  const dataSources = dataSourcesData?.data || []
+
+  const { data: history, isLoading: historyLoading } = useQuery({
+    queryKey: ['sloHistory', selectedSLO?.id],
+    queryFn: () => sloApi.history(selectedSLO!.id),
+    enabled: !!selectedSLO,
+  })
+
+  const onError = (action: string) => (error: any) => {
+    message.error(`Failed to ${action} SLO: ${error.response?.data?.message || error.message}`)
+  }
+
+  const saveMutation = useMutation({
+    mutationFn: (values: CreateSLORequest) =>
+      editingSLO ? sloApi.update(editingSLO.id, values) : sloApi.create(values),
+    onSuccess: () => {
+      message.success(editingSLO ? 'SLO updated successfully' : 'SLO created successfully')
+      setIsModalOpen(false)
+      setEditingSLO(null)
+      form.resetFields()
+      queryClient.invalidateQueries({ queryKey: ['slos'] })
+    },
+    onError: onError('save'),
+  })
+
+  const deleteMutation = useMutation({
+    mutationFn: sloApi.delete,
+    onSuccess: () => {
+      message.success('SLO deleted successfully')
+      queryClient.invalidateQueries({ queryKey: ['slos'] })
+    },
+    onError: onError('delete'),
+  })
+
+  const evaluateMutation = useMutation({
+    mutationFn: sloApi.evaluate,
+    onSuccess: (slo) => {
+      if (slo.lastError) {
+        message.warning(`SLO evaluated with errors: ${slo.lastError}`)
+      } else {
+        message.success('SLO evaluated')
+      }
+      queryClient.invalidateQueries({ queryKey: ['slos'] })
+    },
+    onError: onError('evaluate'),
+  })
+
+  const handleAdd = () => {
+    setEditingSLO(null)
+    form.resetFields()
+    form.setFieldsValue({
+      objective: 99.9,
+      window: 30 * 86400,
+      enabled: true,
+      goodQuery: 'sum(rate(http_requests_total{code!~"5.."}[$window]))',
+      totalQuery: 'sum(rate(http_requests_total[$window]))',
+    })
+    setIsModalOpen(true)
+  }
+
+  const handleEdit = (slo: SLO) => {
+    setEditingSLO(slo)
+    form.setFieldsValue({
+      name: slo.name,
+      description: slo.description,
+      dataSourceId: slo.dataSourceId,
+      goodQuery: slo.goodQuery,
+      totalQuery: slo.totalQuery,
+      objective: slo.objective,
+      window: slo.window,
+      enabled: slo.enabled,
+    })
+    setIsModalOpen(true)
+  }
+
+  const counts = slos.reduce(
+    (acc, slo) => ({ ...acc, [slo.status]: (acc[slo.status] || 0) + 1 }),
+    {} as Partial<Record<SLOStatus, number>>
+  )
+
+  const burnRateColumns: ColumnsType<SLOBurnRateAlert> = [
+    {
+      title: 'Severity',
+      dataIndex: 'severity',
+      key: 'severity',
+      render: (severity: string) => <Tag color={severity === 'critical' ? 'error' : 'warning'}>{severity}</Tag>,
+    },
+    {
+      title: 'Threshold',
+      key: 'factor',
+      render: (_: any, a: SLOBurnRateAlert) => `${a.factor}x over ${formatWindow(a.longWindow)} / ${formatWindow(a.shortWindow)}`,
+    },
+    {
+      title: 'Long Window',
+      dataIndex: 'longBurnRate',
+      key: 'longBurnRate',
+      render: (rate?: number) => (rate === undefined ? '-' : `${rate.toFixed(2)}x`),
+    },
+    {
+      title: 'Short Window',
+      dataIndex: 'shortBurnRate',
+      key: 'shortBurnRate',
+      render: (rate?: number) => (rate === undefined ? '-' : `${rate.toFixed(2)}x`),
+    },
+    {
+      title: 'State',
+      key: 'state',
+      render: (_: any, a: SLOBurnRateAlert) =>
+        a.longBurnRate !== undefined && a.shortBurnRate !== undefined && Math.min(a.longBurnRate, a.shortBurnRate) > a.factor ? (
+          <Tag color="error">Firing</Tag>
+        ) : (
+          <Tag color="success">OK</Tag>
+        ),
+    },
+  ]
+
+  const chartConfig = {
+    data: (history?.points || []).map((p) => ({
+      time: dayjs(p.timestamp).format('MM-DD HH:mm'),
+      value: Number(p.errorBudgetRemaining.toFixed(2)),
+    })),
+    xField: 'time',
+    yField: 'value',
+    height: 240,
+  }
+
+  return (
+    <div style={{ padding: '24px' }}>
+      <div style={{ marginBottom: '24px', display: 'flex', justifyContent: 'space-between', alignItems: 'center' }}>
+        <span style={{ fontSize: '20px', fontWeight: 'bold' }}>
+          <AimOutlined /> Service Level Objectives
+        </span>
+        <Space>
+          <Button icon={<ReloadOutlined />} onClick={() => refetch()}>
+            Refresh
+          </Button>
+          <Button type="primary" icon={<PlusOutlined />} onClick={handleAdd}>
+            Add SLO
+          </Button>
+        </Space>
+      </div>
+
+      {/* Budget status summary */}
+      <Row gutter={16} style={{ marginBottom: '24px' }}>
+        <Col span={6}>
+          <Card>
+            <Statistic title="SLOs" value={slos.length} />
+          </Card>
+        </Col>
+        <Col span={6}>
+          <Card>
+            <Statistic title="Met" value={counts.met || 0} valueStyle={{ color: '#3f8600' }} />
+          </Card>
+        </Col>
+        <Col span={6}>
+          <Card>
+            <Statistic title="At Risk" value={counts.at_risk || 0} valueStyle={{ color: '#faad14' }} />
+          </Card>
+        </Col>
+        <Col span={6}>
+          <Card>
+            <Statistic title="Breached" value={counts.breached || 0} valueStyle={{ color: '#cf1322' }} />
+          </Card>
+        </Col>
+      </Row>
+
+      {/* One panel per SLO with its error budget */}
+      {slos.length === 0 && !isLoading ? (
+        <Card>
+          <Empty description="No SLOs defined" />
+        </Card>
+      ) : (
+        <Row gutter={[16, 16]}>
+          {slos.map((slo) => (
+            <Col key={slo.id} xs={24} md={12} xl={8}>
+              <Card
+                loading={isLoading}
+                title={
+                  <Space>
+                    {slo.name}
+                    <Tag color={statusConfig[slo.status].color}>{statusConfig[slo.status].text}</Tag>
+                    {!slo.enabled && <Tag>Disabled</Tag>}
+                  </Space>
+                }
+                actions={[
+                  <Tooltip title="Burn-down" key="history">
+                    <LineChartOutlined onClick={() => setSelectedSLO(slo)} />
+                  </Tooltip>,
+                  <Tooltip title="Evaluate now" key="evaluate">
+                    <SyncOutlined onClick={() => evaluateMutation.mutate(slo.id)} />
+                  </Tooltip>,
+                  <Tooltip title="Edit" key="edit">
+                    <EditOutlined onClick={() => handleEdit(slo)} />
+                  </Tooltip>,
+                  <Popconfirm
+                    key="delete"
+                    title="Delete this SLO and its burn-rate alert rules?"
+                    onConfirm={() => deleteMutation.mutate(slo.id)}
+                  >
+                    <DeleteOutlined />
+                  </Popconfirm>,
+                ]}
+              >
+                <Row gutter={16} align="middle">
+                  <Col span={10}>
+                    <Progress
+                      type="dashboard"
+                      percent={Math.max(0, Math.min(100, slo.errorBudgetRemaining ?? 0))}
+                      strokeColor={budgetColor(slo.errorBudgetRemaining)}
+                      format={() =>
+                        slo.errorBudgetRemaining === undefined ? '-' : `${slo.errorBudgetRemaining.toFixed(1)}%`
+                      }
+                      size={110}
+                    />
+                    <div style={{ textAlign: 'center', color: '#8c8c8c' }}>Budget left</div>
+                  </Col>
+                  <Col span={14}>
+                    <Statistic
+                      title={`SLI over ${formatWindow(slo.window)}`}
+                      value={slo.sli === undefined ? '-' : slo.sli.toFixed(3)}
+                      suffix={slo.sli === undefined ? undefined : '%'}
+                    />
+                    <div style={{ marginTop: 8, color: '#8c8c8c' }}>Objective {slo.objective}%</div>
+                    {slo.lastEvaluatedAt && (
+                      <div style={{ color: '#8c8c8c' }}>Evaluated {dayjs(slo.lastEvaluatedAt).format('HH:mm:ss')}</div>
+                    )}
+                  </Col>
+                </Row>
+                {slo.lastError && (
+                  <Tooltip title={slo.lastError}>
+                    <Tag color="error" style={{ marginTop: 12, maxWidth: '100%', overflow: 'hidden', textOverflow: 'ellipsis' }}>
+                      {slo.lastError}
+                    </Tag>
+                  </Tooltip>
+                )}
+              </Card>
+            </Col>
+          ))}
+        </Row>
+      )}
+
+      {/* Burn-down and burn-rate alerts of an SLO */}
+      <Drawer
+        title={selectedSLO ? `${selectedSLO.name} error budget` : ''}
+        open={!!selectedSLO}
+        onClose={() => setSelectedSLO(null)}
+        width={720}
+      >
+        {selectedSLO && (
+          <>
+            <Card title="Error budget remaining (%)" loading={historyLoading} style={{ marginBottom: 16 }}>
+              {history && history.points.length > 0 ? <Line {...chartConfig} /> : <Empty description="No data" />}
+            </Card>
+            <Card title="Burn-rate alerts">
+              <Table
+                rowKey="ruleId"
+                columns={burnRateColumns}
+                dataSource={slos.find((s) => s.id === selectedSLO.id)?.burnRateAlerts || selectedSLO.burnRateAlerts}
+                pagination={false}
+                size="small"
+              />
+            </Card>
+          </>
+        )}
+      </Drawer>
+
+      <Modal
+        title={editingSLO ? 'Edit SLO' : 'Add SLO'}
+        open={isModalOpen}
+        onCancel={() => {
+          setIsModalOpen(false)
+          setEditingSLO(null)
+          form.resetFields()
+        }}
+        onOk={() => form.submit()}
+        confirmLoading={saveMutation.isPending}
+        width={640}
+      >
+        <Form form={form} layout="vertical" onFinish={(values) => saveMutation.mutate(values)}>
+          <Form.Item name="name" label="Name" rules={[{ required: true, message: 'Please enter a name' }]}>
+            <Input placeholder="e.g. API availability" />
+          </Form.Item>
+          <Form.Item name="description" label="Description">
+            <Input />
+          </Form.Item>
+          <Form.Item
+            name="dataSourceId"
+            label="Data Source"
+            rules={[{ required: true, message: 'Please select a data source' }]}
+          >
+            <Select placeholder="Select a Prometheus data source">
+              {dataSources.map((ds) => (
+                <Option key={ds.id} value={ds.id}>
+                  {ds.name}
+                </Option>
+              ))}
+            </Select>
+          </Form.Item>
+          <Form.Item
+            name="goodQuery"
+            label="Good Events Query"
+            tooltip="PromQL counting good events; use $window as the range"
+            rules={[{ required: true, message: 'Please enter a query' }]}
+          >
+            <TextArea rows={2} style={{ fontFamily: 'monospace' }} />
+          </Form.Item>
+          <Form.Item
+            name="totalQuery"
+            label="Total Events Query"
+            tooltip="PromQL counting all events; use $window as the range"
+            rules={[{ required: true, message: 'Please enter a query' }]}
+          >
+            <TextArea rows={2} style={{ fontFamily: 'monospace' }} />
+          </Form.Item>
+          <Row gutter={16}>
+            <Col span={8}>
+              <Form.Item name="objective" label="Objective (%)" rules={[{ required: true }]}>
+                <InputNumber min={0.001} max={99.999} step={0.1} style={{ width: '100%' }} />
+              </Form.Item>
+            </Col>
+            <Col span={8}>
+              <Form.Item name="window" label="Window">
+                <Select options={windowOptions} />
+              </Form.Item>
+            </Col>
+            <Col span={8}>
+              <Form.Item name="enabled" label="Enabled" valuePropName="checked">
+                <Switch />
+              </Form.Item>
+            </Col>
+          </Row>
+        </Form>
+      </Modal>
+    </div>
+  )
+}
+
+export default SLOPage
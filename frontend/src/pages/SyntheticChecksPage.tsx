@@ -0,0 +1,581 @@
+import React, { useState } from 'react'
+import { useQuery, useMutation, useQueryClient } from '@tanstack/react-query'
+import {
+  Button,
+  Card,
+  Col,
+  Drawer,
+  Empty,
+  Form,
+  Input,
+  InputNumber,
+  Modal,
+  Popconfirm,
+  Row,
+  Select,
+  Space,
+  Statistic,
+  Switch,
+  Table,
+  Tag,
+  Tooltip,
+  message,
+} from 'antd'
+import {
+  DeleteOutlined,
+  EditOutlined,
+  GlobalOutlined,
+  LineChartOutlined,
+  PlayCircleOutlined,
+  PlusOutlined,
+  ReloadOutlined,
+} from '@ant-design/icons'
+import type { ColumnsType } from 'antd/es/table'
+import dayjs from 'dayjs'
+import { syntheticApi } from '../api/synthetic'
+import { hostApi } from '../api/host'
+import {
+  SYNTHETIC_LOCATION_GATEWAY,
+  type CreateSyntheticCheckRequest,
+  type SyntheticCheck,
+  type SyntheticCheckStatus,
+  type SyntheticCheckType,
+  type SyntheticLocationUptime,
+  type SyntheticResult,
+} from '../types/synthetic'
+
+const statusConfig: Record<SyntheticCheckStatus, { color: string; text: string }> = {
+  up: { color: 'success', text: 'Up' },
+  degraded: { color: 'warning', text: 'Degraded' },
+  down: { color: 'error', text: 'Down' },
+  unknown: { color: 'default', text: 'Unknown' },
+}
+
+const targetPlaceholder: Record<SyntheticCheckType, string> = {
+  http: 'https://example.com/health',
+  tcp: 'db.internal:5432',
+  icmp: 'gateway.internal',
+}
+
+const uptimeColor = (uptime: number) => {
+  if (uptime >= 99.9) return '#3f8600'
+  if (uptime >= 99) return '#faad14'
+  return '#cf1322'
+}
+
+export const SyntheticChecksPage: React.FC = () => {
+  const queryClient = useQueryClient()
+  const [isModalOpen, setIsModalOpen] = useState(false)
+  const [editingCheck, setEditingCheck] = useState<SyntheticCheck | null>(null)
+  const [selectedCheck, setSelectedCheck] = useState<SyntheticCheck | null>(null)
+  const [resultsPage, setResultsPage] = useState(1)
+  const [form] = Form.useForm()
+  const checkType: SyntheticCheckType = Form.useWatch('type', form) || 'http'
+
+  const { data: checks = [], isLoading, refetch } = useQuery({
+    queryKey: ['syntheticChecks'],
+    queryFn: () => syntheticApi.list(),
+    refetchInterval: 15000,
+  })
+
+  const { data: hostsData } = useQuery({
+    queryKey: ['hosts', 'syntheticLocations'],
+    queryFn: () => hostApi.listHosts({ page: 1, pageSize: 100 }),
+  })
+  const hosts = hostsData?.hosts || []
+  const locationName = (location: string) =>
+    location === SYNTHETIC_LOCATION_GATEWAY
+      ? 'Gateway'
+      : hosts.find((h) => h.id === location)?.hostname || location
+
+  const { data: uptime, isLoading: uptimeLoading } = useQuery({
+    queryKey: ['syntheticUptime', selectedCheck?.id],
+    queryFn: () => syntheticApi.uptime(selectedCheck!.id),
+    enabled: !!selectedCheck,
+  })
+
+  const { data: results, isLoading: resultsLoading } = useQuery({
+    queryKey: ['syntheticResults', selectedCheck?.id, resultsPage],
+    queryFn: () => syntheticApi.results(selectedCheck!.id, { page: resultsPage, pageSize: 20 }),
+    enabled: !!selectedCheck,
+  })
+
+  const onError = (action: string) => (error: any) => {
+    message.error(`Failed to ${action} check: ${error.response?.data?.message || error.message}`)
+  }
+
+  const saveMutation = useMutation({
+    mutationFn: (values: CreateSyntheticCheckRequest) => {
+      if (editingCheck) {
+        const { type: _type, ...update } = values
+        return syntheticApi.update(editingCheck.id, update)
+      }
+      return syntheticApi.create(values)
+    },
+    onSuccess: () => {
+      message.success(editingCheck ? 'Check updated successfully' : 'Check created successfully')
+      setIsModalOpen(false)
+      setEditingCheck(null)
+      form.resetFields()
+      queryClient.invalidateQueries({ queryKey: ['syntheticChecks'] })
+    },
+    onError: onError('save'),
+  })
+
+  const deleteMutation = useMutation({
+    mutationFn: syntheticApi.delete,
+    onSuccess: () => {
+      message.success('Check deleted successfully')
+      queryClient.invalidateQueries({ queryKey: ['syntheticChecks'] })
+    },
+    onError: onError('delete'),
+  })
+
+  const runMutation = useMutation({
+    mutationFn: syntheticApi.run,
+    onSuccess: (results) => {
+      const failed = results.filter((r) => !r.success)
+      if (failed.length > 0) {
+        message.warning(`${failed.length} of ${results.length} locations failed: ${failed[0].error}`)
+      } else {
+        message.success(`Check passed from ${results.length} location(s)`)
+      }
+      queryClient.invalidateQueries({ queryKey: ['syntheticChecks'] })
+      queryClient.invalidateQueries({ queryKey: ['syntheticResults'] })
+      queryClient.invalidateQueries({ queryKey: ['syntheticUptime'] })
+    },
+    onError: onError('run'),
+  })
+
+  const handleAdd = () => {
+    setEditingCheck(null)
+    form.resetFields()
+    form.setFieldsValue({
+      type: 'http',
+      interval: 60,
+      timeout: 10,
+      locations: [SYNTHETIC_LOCATION_GATEWAY],
+      failureThreshold: 1,
+      severity: 'critical',
+      enabled: true,
+    })
+    setIsModalOpen(true)
+  }
+
+  const handleEdit = (check: SyntheticCheck) => {
+    setEditingCheck(check)
+    form.setFieldsValue({
+      name: check.name,
+      type: check.type,
+      target: check.target,
+      method: check.method,
+      interval: check.interval,
+      timeout: check.timeout,
+      locations: check.locations,
+      expectedStatus: check.expectedStatus,
+      bodyRegex: check.bodyRegex,
+      maxLatency: check.maxLatency,
+      failureThreshold: check.failureThreshold,
+      severity: check.severity,
+      enabled: check.enabled,
+    })
+    setIsModalOpen(true)
+  }
+
+  const counts = checks.reduce(
+    (acc, check) => ({ ...acc, [check.status]: (acc[check.status] || 0) + 1 }),
+    {} as Partial<Record<SyntheticCheckStatus, number>>
+  )
+
+  const columns: ColumnsType<SyntheticCheck> = [
+    {
+      title: 'Name',
+      dataIndex: 'name',
+      key: 'name',
+      render: (name: string, check) => (
+        <Space>
+          <a onClick={() => setSelectedCheck(check)}>{name}</a>
+          {!check.enabled && <Tag>Disabled</Tag>}
+        </Space>
+      ),
+    },
+    {
+      title: 'Type',
+      dataIndex: 'type',
+      key: 'type',
+      render: (type: string) => <Tag>{type.toUpperCase()}</Tag>,
+    },
+    {
+      title: 'Target',
+      dataIndex: 'target',
+      key: 'target',
+      ellipsis: true,
+    },
+    {
+      title: 'Status',
+      dataIndex: 'status',
+      key: 'status',
+      render: (status: SyntheticCheckStatus, check) => (
+        <Tooltip title={check.lastError}>
+          <Tag color={statusConfig[status].color}>{statusConfig[status].text}</Tag>
+        </Tooltip>
+      ),
+    },
+    {
+      title: 'Locations',
+      key: 'locations',
+      render: (_: any, check) =>
+        check.status === 'unknown'
+          ? check.locations.length
+          : `${check.locations.length - check.failingCount}/${check.locations.length} passing`,
+    },
+    {
+      title: 'Latency',
+      dataIndex: 'lastLatency',
+      key: 'lastLatency',
+      render: (latency?: number) => (latency === undefined ? '-' : `${latency} ms`),
+    },
+    {
+      title: 'Interval',
+      dataIndex: 'interval',
+      key: 'interval',
+      render: (interval: number) => `${interval}s`,
+    },
+    {
+      title: 'Last Checked',
+      dataIndex: 'lastCheckedAt',
+      key: 'lastCheckedAt',
+      render: (time?: string) => (time ? dayjs(time).format('YYYY-MM-DD HH:mm:ss') : '-'),
+    },
+    {
+      title: 'Actions',
+      key: 'actions',
+      render: (_: any, check) => (
+        <Space>
+          <Tooltip title="Uptime and results">
+            <Button type="text" icon={<LineChartOutlined />} onClick={() => setSelectedCheck(check)} />
+          </Tooltip>
+          <Tooltip title="Run now">
+            <Button
+              type="text"
+              icon={<PlayCircleOutlined />}
+              loading={runMutation.isPending && runMutation.variables === check.id}
+              onClick={() => runMutation.mutate(check.id)}
+            />
+          </Tooltip>
+          <Tooltip title="Edit">
+            <Button type="text" icon={<EditOutlined />} onClick={() => handleEdit(check)} />
+          </Tooltip>
+          <Popconfirm
+            title="Delete this check with its results and alert rule?"
+            onConfirm={() => deleteMutation.mutate(check.id)}
+          >
+            <Button type="text" danger icon={<DeleteOutlined />} />
+          </Popconfirm>
+        </Space>
+      ),
+    },
+  ]
+
+  const uptimeColumns: ColumnsType<SyntheticLocationUptime> = [
+    {
+      title: 'Location',
+      dataIndex: 'location',
+      key: 'location',
+      render: (location: string) => locationName(location),
+    },
+    {
+      title: 'Uptime',
+      dataIndex: 'uptime',
+      key: 'uptime',
+      render: (value: number) => <span style={{ color: uptimeColor(value) }}>{value.toFixed(3)}%</span>,
+    },
+    {
+      title: 'Probes',
+      key: 'probes',
+      render: (_: any, u) => `${u.successes}/${u.probes}`,
+    },
+    {
+      title: 'Avg Latency',
+      dataIndex: 'avgLatency',
+      key: 'avgLatency',
+      render: (value: number) => `${Math.round(value)} ms`,
+    },
+    {
+      title: 'Max Latency',
+      dataIndex: 'maxLatency',
+      key: 'maxLatency',
+      render: (value: number) => `${value} ms`,
+    },
+  ]
+
+  const resultColumns: ColumnsType<SyntheticResult> = [
+    {
+      title: 'Time',
+      dataIndex: 'checkedAt',
+      key: 'checkedAt',
+      render: (time: string) => dayjs(time).format('MM-DD HH:mm:ss'),
+    },
+    {
+      title: 'Location',
+      dataIndex: 'location',
+      key: 'location',
+      render: (location: string) => locationName(location),
+    },
+    {
+      title: 'Result',
+      dataIndex: 'success',
+      key: 'success',
+      render: (success: boolean) => <Tag color={success ? 'success' : 'error'}>{success ? 'Pass' : 'Fail'}</Tag>,
+    },
+    {
+      title: 'Latency',
+      dataIndex: 'latency',
+      key: 'latency',
+      render: (latency: number) => `${latency} ms`,
+    },
+    {
+      title: 'Status Code',
+      dataIndex: 'statusCode',
+      key: 'statusCode',
+      render: (code?: number) => code ?? '-',
+    },
+    {
+      title: 'Error',
+      dataIndex: 'error',
+      key: 'error',
+      ellipsis: true,
+    },
+  ]
+
+  return (
+    <div style={{ padding: '24px' }}>
+      <div style={{ marginBottom: '24px', display: 'flex', justifyContent: 'space-between', alignItems: 'center' }}>
+        <span style={{ fontSize: '20px', fontWeight: 'bold' }}>
+          <GlobalOutlined /> Synthetic Checks
+        </span>
+        <Space>
+          <Button icon={<ReloadOutlined />} onClick={() => refetch()}>
+            Refresh
+          </Button>
+          <Button type="primary" icon={<PlusOutlined />} onClick={handleAdd}>
+            Add Check
+          </Button>
+        </Space>
+      </div>
+
+      {/* Status summary */}
+      <Row gutter={16} style={{ marginBottom: '24px' }}>
+        <Col span={6}>
+          <Card>
+            <Statistic title="Checks" value={checks.length} />
+          </Card>
+        </Col>
+        <Col span={6}>
+          <Card>
+            <Statistic title="Up" value={counts.up || 0} valueStyle={{ color: '#3f8600' }} />
+          </Card>
+        </Col>
+        <Col span={6}>
+          <Card>
+            <Statistic title="Degraded" value={counts.degraded || 0} valueStyle={{ color: '#faad14' }} />
+          </Card>
+        </Col>
+        <Col span={6}>
+          <Card>
+            <Statistic title="Down" value={counts.down || 0} valueStyle={{ color: '#cf1322' }} />
+          </Card>
+        </Col>
+      </Row>
+
+      <Card>
+        <Table
+          rowKey="id"
+          columns={columns}
+          dataSource={checks}
+          loading={isLoading}
+          pagination={{ pageSize: 20, showTotal: (total) => `Total ${total} checks` }}
+        />
+      </Card>
+
+      {/* Uptime per location and recent results of a check */}
+      <Drawer
+        title={selectedCheck ? `${selectedCheck.name} uptime` : ''}
+        open={!!selectedCheck}
+        onClose={() => {
+          setSelectedCheck(null)
+          setResultsPage(1)
+        }}
+        width={800}
+      >
+        {selectedCheck && (
+          <>
+            <Card title="Last 24 hours" loading={uptimeLoading} style={{ marginBottom: 16 }}>
+              {uptime && uptime.overall.probes > 0 ? (
+                <>
+                  <Row gutter={16} style={{ marginBottom: 16 }}>
+                    <Col span={8}>
+                      <Statistic
+                        title="Uptime"
+                        value={uptime.overall.uptime.toFixed(3)}
+                        suffix="%"
+                        valueStyle={{ color: uptimeColor(uptime.overall.uptime) }}
+                      />
+                    </Col>
+                    <Col span={8}>
+                      <Statistic title="Avg Latency" value={Math.round(uptime.overall.avgLatency)} suffix="ms" />
+                    </Col>
+                    <Col span={8}>
+                      <Statistic title="Max Latency" value={uptime.overall.maxLatency} suffix="ms" />
+                    </Col>
+                  </Row>
+                  <Table
+                    rowKey="location"
+                    columns={uptimeColumns}
+                    dataSource={uptime.locations}
+                    pagination={false}
+                    size="small"
+                  />
+                </>
+              ) : (
+                <Empty description="No results yet" />
+              )}
+            </Card>
+            <Card title="Results">
+              <Table
+                rowKey="id"
+                columns={resultColumns}
+                dataSource={results?.data || []}
+                loading={resultsLoading}
+                size="small"
+                pagination={{
+                  current: resultsPage,
+                  pageSize: 20,
+                  total: results?.total || 0,
+                  onChange: setResultsPage,
+                }}
+              />
+            </Card>
+          </>
+        )}
+      </Drawer>
+
+      <Modal
+        title={editingCheck ? 'Edit Check' : 'Add Check'}
+        open={isModalOpen}
+        onCancel={() => {
+          setIsModalOpen(false)
+          setEditingCheck(null)
+          form.resetFields()
+        }}
+        onOk={() => form.submit()}
+        confirmLoading={saveMutation.isPending}
+        width={640}
+      >
+        <Form form={form} layout="vertical" onFinish={(values) => saveMutation.mutate(values)}>
+          <Form.Item name="name" label="Name" rules={[{ required: true, message: 'Please enter a name' }]}>
+            <Input placeholder="e.g. Public API" />
+          </Form.Item>
+          <Row gutter={16}>
+            <Col span={8}>
+              <Form.Item name="type" label="Type">
+                <Select
+                  disabled={!!editingCheck}
+                  options={[
+                    { value: 'http', label: 'HTTP(S)' },
+                    { value: 'tcp', label: 'TCP' },
+                    { value: 'icmp', label: 'ICMP' },
+                  ]}
+                />
+              </Form.Item>
+            </Col>
+            <Col span={16}>
+              <Form.Item name="target" label="Target" rules={[{ required: true, message: 'Please enter a target' }]}>
+                <Input placeholder={targetPlaceholder[checkType]} />
+              </Form.Item>
+            </Col>
+          </Row>
+          {checkType === 'http' && (
+            <Row gutter={16}>
+              <Col span={6}>
+                <Form.Item name="method" label="Method">
+                  <Select
+                    allowClear
+                    placeholder="GET"
+                    options={['GET', 'HEAD', 'POST', 'OPTIONS'].map((m) => ({ value: m, label: m }))}
+                  />
+                </Form.Item>
+              </Col>
+              <Col span={8}>
+                <Form.Item name="expectedStatus" label="Expected Status" tooltip="Codes and ranges; 2xx and 3xx when empty">
+                  <Input placeholder="200-299,301" />
+                </Form.Item>
+              </Col>
+              <Col span={10}>
+                <Form.Item name="bodyRegex" label="Body Regex">
+                  <Input placeholder='"status":\s*"ok"' style={{ fontFamily: 'monospace' }} />
+                </Form.Item>
+              </Col>
+            </Row>
+          )}
+          <Row gutter={16}>
+            <Col span={8}>
+              <Form.Item name="interval" label="Interval (s)">
+                <InputNumber min={10} max={86400} style={{ width: '100%' }} />
+              </Form.Item>
+            </Col>
+            <Col span={8}>
+              <Form.Item name="timeout" label="Timeout (s)">
+                <InputNumber min={1} max={60} style={{ width: '100%' }} />
+              </Form.Item>
+            </Col>
+            <Col span={8}>
+              <Form.Item name="maxLatency" label="Max Latency (ms)" tooltip="Fail slower probes; empty to not assert">
+                <InputNumber min={0} style={{ width: '100%' }} />
+              </Form.Item>
+            </Col>
+          </Row>
+          <Form.Item
+            name="locations"
+            label="Locations"
+            tooltip="The gateway and hosts whose agents run the probe"
+            rules={[{ required: true, message: 'Please select at least one location' }]}
+          >
+            <Select
+              mode="multiple"
+              options={[
+                { value: SYNTHETIC_LOCATION_GATEWAY, label: 'Gateway' },
+                ...hosts.map((h) => ({ value: h.id, label: `${h.hostname} (${h.ipAddress})` })),
+              ]}
+            />
+          </Form.Item>
+          <Row gutter={16}>
+            <Col span={8}>
+              <Form.Item name="failureThreshold" label="Failing Locations" tooltip="Failing locations that make the check down and alert">
+                <InputNumber min={1} style={{ width: '100%' }} />
+              </Form.Item>
+            </Col>
+            <Col span={8}>
+              <Form.Item name="severity" label="Alert Severity">
+                <Select
+                  options={[
+                    { value: 'info', label: 'Info' },
+                    { value: 'warning', label: 'Warning' },
+                    { value: 'critical', label: 'Critical' },
+                  ]}
+                />
+              </Form.Item>
+            </Col>
+            <Col span={8}>
+              <Form.Item name="enabled" label="Enabled" valuePropName="checked">
+                <Switch />
+              </Form.Item>
+            </Col>
+          </Row>
+        </Form>
+      </Modal>
+    </div>
+  )
+}
+
+export default SyntheticChecksPage
@@ -0,0 +1,344 @@
+import React, { useEffect, useMemo, useState } from 'react'
+import { useNavigate } from 'react-router-dom'
+import { useQuery } from '@tanstack/react-query'
+import { Alert, Button, Card, Descriptions, Drawer, Empty, Input, Select, Space, Spin, Switch, Tag } from 'antd'
+import { ApartmentOutlined, ReloadOutlined } from '@ant-design/icons'
+import { topologyApi } from '../api/topology'
+import { clusterApi } from '../api/cluster'
+import { useAuthStore } from '../store/authStore'
+import type {
+  TopologyDelta,
+  TopologyEdge,
+  TopologyGraph,
+  TopologyHealth,
+  TopologyKind,
+  TopologyNode,
+} from '../types/topology'
+
+const { Option } = Select
+
+const healthColors: Record<TopologyHealth, string> = {
+  unknown: '#bfbfbf',
+  healthy: '#52c41a',
+  warning: '#faad14',
+  critical: '#f5222d',
+}
+
+const kindLabels: Record<TopologyKind, string> = {
+  cluster: 'Cluster',
+  node: 'Node',
+  pod: 'Pod',
+  service: 'Service',
+  host: 'Host',
+}
+
+// Rows of a cluster band, top to bottom
+const kindRows: Record<TopologyKind, number> = {
+  cluster: 0,
+  node: 1,
+  host: 1,
+  service: 2,
+  pod: 3,
+}
+
+const COLUMN_WIDTH = 90
+const ROW_HEIGHT = 90
+const BAND_GAP = 40
+const RADIUS = 14
+
+const edgeKey = (edge: TopologyEdge) => `${edge.source}|${edge.target}|${edge.kind}`
+
+// applyDelta applies a topology change to the graph, or returns null when the
+// graph does not hold the revision the change starts from
+function applyDelta(graph: TopologyGraph, delta: TopologyDelta): TopologyGraph | null {
+  const sourceIndex = graph.sources.findIndex((s) => (s.clusterId || '') === (delta.clusterId || ''))
+  if (sourceIndex < 0 || graph.sources[sourceIndex].revision !== delta.previousRevision) {
+    return null
+  }
+
+  const nodes = new Map(graph.nodes.map((n) => [n.id, n]))
+  delta.removed?.forEach((id) => nodes.delete(id))
+  delta.upserted?.forEach((n) => nodes.set(n.id, n))
+
+  const edges = new Map(graph.edges.map((e) => [edgeKey(e), e]))
+  delta.removedEdges?.forEach((e) => edges.delete(edgeKey(e)))
+  delta.addedEdges?.forEach((e) => edges.set(edgeKey(e), e))
+
+  const sources = [...graph.sources]
+  sources[sourceIndex] = { ...sources[sourceIndex], revision: delta.revision }
+  return {
+    ...graph,
+    nodes: Array.from(nodes.values()),
+    edges: Array.from(edges.values()).filter((e) => nodes.has(e.source) && nodes.has(e.target)),
+    sources,
+  }
+}
+
+interface Placed {
+  node: TopologyNode
+  x: number
+  y: number
+}
+
+// layout places each cluster in a band of rows by kind, with managed hosts next
+// to the nodes they are and the remaining hosts in a band of their own
+function layout(graph: TopologyGraph): { placed: Map<string, Placed>; width: number; height: number } {
+  const bands = new Map<string, TopologyNode[]>()
+  const hostCluster = new Map<string, string>()
+  graph.edges.forEach((e) => {
+    if (e.kind === 'machine') {
+      const node = graph.nodes.find((n) => n.id === e.target)
+      if (node?.clusterId) hostCluster.set(e.source, node.clusterId)
+    }
+  })
+  graph.nodes.forEach((n) => {
+    const band = n.clusterId || hostCluster.get(n.id) || 'hosts'
+    if (!bands.has(band)) bands.set(band, [])
+    bands.get(band)!.push(n)
+  })
+
+  const placed = new Map<string, Placed>()
+  let top = RADIUS * 2
+  let width = 0
+  bands.forEach((members) => {
+    const rows: TopologyNode[][] = [[], [], [], []]
+    members.forEach((n) => rows[kindRows[n.kind]].push(n))
+    const used = rows.filter((row) => row.length > 0)
+    used.forEach((row, r) => {
+      row.sort((a, b) => a.name.localeCompare(b.name))
+      row.forEach((n, i) => {
+        placed.set(n.id, { node: n, x: COLUMN_WIDTH / 2 + i * COLUMN_WIDTH, y: top + r * ROW_HEIGHT })
+      })
+      width = Math.max(width, row.length * COLUMN_WIDTH)
+    })
+    top += used.length * ROW_HEIGHT + BAND_GAP
+  })
+  return { placed, width: Math.max(width, 600), height: top }
+}
+
+export const TopologyPage: React.FC = () => {
+  const navigate = useNavigate()
+  const [clusterIds, setClusterIds] = useState<string[]>([])
+  const [namespace, setNamespace] = useState('')
+  const [kinds, setKinds] = useState<TopologyKind[]>([])
+  const [health, setHealth] = useState<TopologyHealth | undefined>()
+  const [showHosts, setShowHosts] = useState(true)
+  const [graph, setGraph] = useState<TopologyGraph | null>(null)
+  const [selected, setSelected] = useState<TopologyNode | null>(null)
+  const [live, setLive] = useState(false)
+
+  const { data: clusters } = useQuery({
+    queryKey: ['clusters', 'topology'],
+    queryFn: () => clusterApi.listClusters({ pageSize: 100 }),
+  })
+
+  const { data, isLoading, error, refetch } = useQuery({
+    queryKey: ['topology', clusterIds, namespace, kinds, health, showHosts],
+    queryFn: () => topologyApi.getTopology({ clusterIds, namespace, kinds, health, hosts: showHosts }),
+  })
+
+  useEffect(() => {
+    if (data) setGraph(data)
+  }, [data])
+
+  // Changes are applied as they arrive; the server does not filter them, so a
+  // filtered map is refetched instead
+  const filtered = namespace !== '' || kinds.length > 0 || health !== undefined
+  useEffect(() => {
+    const token = useAuthStore.getState().accessToken || ''
+    // Browsers cannot set headers on websockets; the token rides in the subprotocol
+    const ws = new WebSocket(topologyApi.changesUrl(), ['bearer', token])
+    ws.onopen = () => setLive(true)
+    ws.onclose = () => setLive(false)
+    ws.onmessage = (message) => {
+      const msg = JSON.parse(message.data)
+      if (msg.type === 'dropped') {
+        refetch()
+        return
+      }
+      if (msg.type !== 'event' || msg.event?.type !== 'topology.changed') return
+      const delta = msg.event.data as TopologyDelta
+      if (clusterIds.length > 0 && delta.clusterId && !clusterIds.includes(delta.clusterId)) return
+      if (filtered) {
+        refetch()
+        return
+      }
+      setGraph((current) => {
+        if (!current) return current
+        const next = applyDelta(current, delta)
+        if (!next) refetch()
+        return next || current
+      })
+    }
+    return () => ws.close()
+  }, [clusterIds, filtered, refetch])
+
+  const { placed, width, height } = useMemo(
+    () => (graph ? layout(graph) : { placed: new Map<string, Placed>(), width: 0, height: 0 }),
+    [graph]
+  )
+
+  const failedSources = graph?.sources.filter((s) => s.error) || []
+
+  return (
+    <div style={{ padding: '24px' }}>
+      <div style={{ marginBottom: '16px', display: 'flex', justifyContent: 'space-between', alignItems: 'center' }}>
+        <span style={{ fontSize: '20px', fontWeight: 'bold' }}>
+          <ApartmentOutlined /> Topology
+        </span>
+        <Space>
+          <Tag color={live ? 'green' : 'default'}>{live ? 'Live' : 'Offline'}</Tag>
+          <Button icon={<ReloadOutlined />} onClick={() => refetch()}>
+            Refresh
+          </Button>
+        </Space>
+      </div>
+
+      <Card style={{ marginBottom: '16px' }}>
+        <Space wrap>
+          <Select
+            mode="multiple"
+            placeholder="All clusters"
+            style={{ minWidth: 220 }}
+            value={clusterIds}
+            onChange={setClusterIds}
+            allowClear
+          >
+            {clusters?.clusters.map((c) => (
+              <Option key={c.id} value={c.id}>
+                {c.name}
+              </Option>
+            ))}
+          </Select>
+          <Input
+            placeholder="Namespace"
+            style={{ width: 160 }}
+            allowClear
+            onPressEnter={(e) => setNamespace((e.target as HTMLInputElement).value.trim())}
+            onChange={(e) => e.target.value === '' && setNamespace('')}
+          />
+          <Select
+            mode="multiple"
+            placeholder="All kinds"
+            style={{ minWidth: 200 }}
+            value={kinds}
+            onChange={setKinds}
+            allowClear
+          >
+            {(Object.keys(kindLabels) as TopologyKind[]).map((k) => (
+              <Option key={k} value={k}>
+                {kindLabels[k]}
+              </Option>
+            ))}
+          </Select>
+          <Select placeholder="Any health" style={{ width: 140 }} value={health} onChange={setHealth} allowClear>
+            <Option value="warning">Warning or worse</Option>
+            <Option value="critical">Critical</Option>
+          </Select>
+          <Space>
+            <Switch checked={showHosts} onChange={setShowHosts} />
+            Managed hosts
+          </Space>
+        </Space>
+      </Card>
+
+      {failedSources.map((s) => (
+        <Alert
+          key={s.clusterId || 'hosts'}
+          style={{ marginBottom: '8px' }}
+          type="warning"
+          showIcon
+          message={`${s.clusterName || s.clusterId || 'Hosts'}: ${s.error}`}
+        />
+      ))}
+      {graph?.truncated && (
+        <Alert style={{ marginBottom: '8px' }} type="info" showIcon message="The map is too large; narrow it with the filters to see everything" />
+      )}
+      {error && <Alert style={{ marginBottom: '8px' }} type="error" showIcon message="Failed to load topology" description={(error as Error).message} />}
+
+      <Card bodyStyle={{ overflow: 'auto', padding: 0 }}>
+        {isLoading && !graph ? (
+          <div style={{ padding: '48px', textAlign: 'center' }}>
+            <Spin size="large" />
+          </div>
+        ) : !graph || graph.nodes.length === 0 ? (
+          <Empty style={{ padding: '48px' }} />
+        ) : (
+          <svg width={width} height={height}>
+            {graph.edges.map((e) => {
+              const from = placed.get(e.source)
+              const to = placed.get(e.target)
+              if (!from || !to) return null
+              return (
+                <line
+                  key={edgeKey(e)}
+                  x1={from.x}
+                  y1={from.y}
+                  x2={to.x}
+                  y2={to.y}
+                  stroke={e.kind === 'selects' ? '#91caff' : '#d9d9d9'}
+                  strokeDasharray={e.kind === 'machine' ? '4 3' : undefined}
+                />
+              )
+            })}
+            {Array.from(placed.values()).map(({ node, x, y }) => (
+              <g key={node.id} transform={`translate(${x},${y})`} style={{ cursor: 'pointer' }} onClick={() => setSelected(node)}>
+                <circle
+                  r={node.kind === 'cluster' ? RADIUS + 4 : RADIUS}
+                  fill={healthColors[node.health]}
+                  stroke={node.kind === 'host' || node.kind === 'service' ? '#595959' : '#ffffff'}
+                  strokeWidth={2}
+                />
+                <text y={4} textAnchor="middle" fontSize={10} fill="#ffffff">
+                  {kindLabels[node.kind][0]}
+                </text>
+                {node.alerts + node.anomalies > 0 && (
+                  <text x={RADIUS} y={-RADIUS} fontSize={10} fill="#f5222d">
+                    {node.alerts + node.anomalies}
+                  </text>
+                )}
+                <text y={RADIUS + 14} textAnchor="middle" fontSize={10}>
+                  <title>{node.name}</title>
+                  {node.name.length > 14 ? `${node.name.slice(0, 13)}…` : node.name}
+                </text>
+              </g>
+            ))}
+          </svg>
+        )}
+      </Card>
+
+      <Drawer open={!!selected} onClose={() => setSelected(null)} title={selected?.name} width={420}>
+        {selected && (
+          <>
+            <Descriptions column={1} size="small" bordered>
+              <Descriptions.Item label="Kind">{kindLabels[selected.kind]}</Descriptions.Item>
+              <Descriptions.Item label="Health">
+                <Tag color={healthColors[selected.health]}>{selected.health}</Tag>
+              </Descriptions.Item>
+              <Descriptions.Item label="Status">{selected.status}</Descriptions.Item>
+              {selected.namespace && <Descriptions.Item label="Namespace">{selected.namespace}</Descriptions.Item>}
+              <Descriptions.Item label="Firing alerts">{selected.alerts}</Descriptions.Item>
+              <Descriptions.Item label="Open anomalies">{selected.anomalies}</Descriptions.Item>
+              {Object.entries(selected.attributes || {}).map(([k, v]) => (
+                <Descriptions.Item key={k} label={k}>
+                  {v}
+                </Descriptions.Item>
+              ))}
+            </Descriptions>
+            <Space style={{ marginTop: '16px' }}>
+              {selected.hostId && <Button onClick={() => navigate(`/hosts/${selected.hostId}`)}>Open host</Button>}
+              {selected.kind === 'cluster' && selected.clusterId && (
+                <Button onClick={() => navigate(`/clusters/${selected.clusterId}`)}>Open cluster</Button>
+              )}
+              {selected.kind === 'pod' && selected.clusterId && (
+                <Button onClick={() => navigate(`/clusters/${selected.clusterId}/namespaces/${selected.namespace}/pods/${selected.name}`)}>
+                  Open pod
+                </Button>
+              )}
+            </Space>
+          </>
+        )}
+      </Drawer>
+    </div>
+  )
+}
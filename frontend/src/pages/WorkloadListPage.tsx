@@ -1,5 +1,5 @@
 import React, { useState } from 'react'
-import { useParams, useNavigate } from 'react-router-dom'
+import { useParams, useNavigate, useSearchParams } from 'react-router-dom'
 import { useQuery } from '@tanstack/react-query'
 import { Button, Space, message, Table, Tag, Tabs, Select, Spin, Modal } from 'antd'
 import {
@@ -20,8 +20,10 @@ const { Option } = Select
 export const WorkloadListPage: React.FC = () => {
   const { id: clusterId } = useParams<{ id: string }>()
   const navigate = useNavigate()
-  const [namespace, setNamespace] = useState<string>('default')
-  const [activeTab, setActiveTab] = useState('pods')
+  // Links from search open a tab of a namespace with ?tab and ?namespace
+  const [searchParams] = useSearchParams()
+  const [namespace, setNamespace] = useState<string>(searchParams.get('namespace') || 'default')
+  const [activeTab, setActiveTab] = useState(searchParams.get('tab') || 'pods')
   const [logsModal, setLogsModal] = useState<{ visible: boolean; podName: string; logs: string }>({
     visible: false,
     podName: '',
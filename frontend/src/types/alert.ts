@@ -1,4 +1,6 @@
 // Alert types
+import type { AlertTicket } from './ticketing'
+
 export type AlertSeverity = 'info' | 'warning' | 'critical'
 export type AlertStatus = 'pending' | 'firing' | 'resolved' | 'silenced'
 
@@ -40,8 +42,11 @@ export interface Alert {
   updatedAt: string
   resolvedAt?: string
   silencedUntil?: string
+  acknowledgedAt?: string
+  acknowledgedBy?: string // User who acknowledged the alert
   labels: string
   annotations: string
+  tickets?: AlertTicket[] // Issues opened in ticketing systems
 }
 
 export interface Event {
@@ -0,0 +1,92 @@
+// Dashboard annotation types
+
+export type AnnotationKind = 'deployment' | 'incident' | 'maintenance' | 'custom'
+export type AnnotationSource = 'manual' | 'webhook' | 'maintenance' | 'helm'
+
+// Applies to one dashboard, the dashboards of a cluster, or every dashboard
+// when neither dashboardId nor clusterId is set
+export interface Annotation {
+  id: string
+  userId: string
+  dashboardId?: string
+  clusterId?: string
+  kind: AnnotationKind
+  title: string
+  text?: string
+  tags: string[]
+  startsAt: string
+  endsAt?: string // Empty for a point in time
+  source: AnnotationSource
+  sourceId?: string
+  createdBy?: string
+  createdAt: string
+  updatedAt: string
+}
+
+export interface CreateAnnotationRequest {
+  dashboardId?: string
+  clusterId?: string
+  kind: AnnotationKind
+  title: string
+  text?: string
+  tags?: string[]
+  startsAt?: string // Now by default
+  endsAt?: string
+}
+
+export type UpdateAnnotationRequest = Partial<
+  Pick<CreateAnnotationRequest, 'kind' | 'title' | 'text' | 'tags' | 'startsAt' | 'endsAt'>
+>
+
+export interface ListAnnotationsParams {
+  page?: number
+  pageSize?: number
+  from?: string
+  to?: string
+  kind?: AnnotationKind
+  tag?: string[]
+  dashboardId?: string
+  clusterId?: string
+}
+
+export interface ListAnnotationsResponse {
+  data: Annotation[]
+  total: number
+  page: number
+  pageSize: number
+}
+
+export interface AnnotationWebhook {
+  id: string
+  userId: string
+  name: string
+  kind: AnnotationKind
+  dashboardId?: string
+  clusterId?: string
+  tags: string[]
+  lastUsedAt?: string
+  createdAt: string
+  updatedAt: string
+  token?: string // Only when created or rotated
+}
+
+export interface CreateAnnotationWebhookRequest {
+  name: string
+  kind?: AnnotationKind // deployment by default
+  dashboardId?: string
+  clusterId?: string
+  tags?: string[]
+}
+
+// An annotation in a dashboard render; maintenance window occurrences have no id
+export interface DashboardAnnotation {
+  id?: string
+  kind: AnnotationKind
+  title: string
+  text?: string
+  tags: string[]
+  time: string
+  timeEnd?: string
+  source: AnnotationSource
+  sourceId?: string
+}
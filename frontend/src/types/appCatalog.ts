@@ -0,0 +1,81 @@
+// App catalog types
+
+export type AppInputType = 'string' | 'integer' | 'boolean' | 'select'
+
+export interface AppCatalogInput {
+  key: string // Dotted values path, e.g. controller.replicaCount
+  label: string
+  description?: string
+  type: AppInputType
+  default?: string | number | boolean
+  required?: boolean
+  options?: string[]
+  pattern?: string
+  minimum?: number
+  maximum?: number
+  secret?: boolean // Never returned with the installation's inputs
+}
+
+export interface AppCatalogEntry {
+  id: string
+  name: string
+  description: string
+  category: string
+  icon?: string
+  home?: string
+  repository: string
+  repositoryUrl: string
+  chart: string
+  chartVersion: string
+  defaultNamespace: string
+  defaultValues: string
+  inputs: AppCatalogInput[]
+  minDeployments: number
+}
+
+export type AppInstallationStatus = 'installing' | 'upgrading' | 'healthy' | 'degraded' | 'failed' | 'uninstalled'
+
+export interface AppHealthCheck {
+  name: string
+  passed: boolean
+  message?: string
+}
+
+export interface AppInstallation {
+  id: string
+  userId: string
+  appId: string
+  clusterId: string
+  namespace: string
+  releaseName: string
+  releaseId: string
+  chartVersion: string
+  inputs: Record<string, string | number | boolean>
+  status: AppInstallationStatus
+  statusChangedAt: string
+  checks: AppHealthCheck[] | null
+  checkedAt?: string
+  notify: boolean
+  createdBy?: string
+  createdAt: string
+  updatedAt: string
+}
+
+export interface InstallAppRequest {
+  clusterId: string
+  namespace?: string // The app's default namespace when empty
+  releaseName?: string // The app's ID when empty
+  inputs?: Record<string, string | number | boolean>
+  notify?: boolean
+}
+
+export interface UpgradeAppRequest {
+  chartVersion?: string
+  inputs?: Record<string, string | number | boolean> // Inputs left out keep their values
+  notify?: boolean
+}
+
+export interface AppInstallationListParams {
+  clusterId?: string
+  status?: AppInstallationStatus
+}
@@ -15,6 +15,9 @@ export interface AuditLog {
   oldValue?: string
   newValue?: string
   createdAt: string
+  sequence?: number
+  prevHash?: string
+  hash?: string
 }
 
 export interface AuditLogFilter {
@@ -58,3 +61,35 @@ export interface AuditLogsResponse {
 export interface AuditLogSummaryResponse {
   data: AuditLogSummary
 }
+
+export type AuditChainProblemKind = 'gap' | 'hash_mismatch' | 'chain_break' | 'checkpoint_mismatch'
+
+export interface AuditChainProblem {
+  sequence: number
+  kind: AuditChainProblemKind
+  message: string
+}
+
+export interface AuditChainVerification {
+  valid: boolean
+  firstSequence: number
+  lastSequence: number
+  checked: number
+  checkpoints: number
+  unsealed: number
+  problems: AuditChainProblem[]
+  truncated?: boolean
+  verifiedAt: string
+}
+
+export interface AuditCheckpoint {
+  id: string
+  createdAt: string
+  fromSequence: number
+  sequence: number
+  hash: string
+  exportTargetId?: string
+  exportKey?: string
+  exportedAt?: string
+  exportError?: string
+}
@@ -0,0 +1,25 @@
+// Batch API types
+
+// One GET request of a batch; path is an /api/v1 path with its query string
+export interface BatchItem {
+  id?: string
+  path: string
+}
+
+export interface BatchError {
+  code: string
+  message: string
+}
+
+// The response to one item of a batch. body is what the endpoint answered with;
+// items the batch itself refused carry error instead.
+export interface BatchResult<T = unknown> {
+  id: string
+  status: number
+  body?: T
+  error?: BatchError
+}
+
+export interface BatchResponse {
+  responses: BatchResult[]
+}
@@ -0,0 +1,94 @@
+// Canary and blue/green rollout types
+
+export type CanaryStrategy = 'canary' | 'blue_green'
+export type CanaryTraffic = 'service' | 'nginx'
+export type CanaryRolloutStatus = 'progressing' | 'paused' | 'promoting' | 'promoted' | 'rolled_back' | 'failed'
+
+export interface CanaryStep {
+  weight: number // Percent of traffic to the new image
+  duration: number // Seconds held once the traffic shifted
+  manual: boolean // Wait to be promoted before shifting to the step
+}
+
+// A Prometheus query whose result must stay within bounds
+export interface CanaryMetric {
+  name: string
+  dataSourceId: string
+  query: string
+  max?: number
+  min?: number
+}
+
+export interface CanaryCheck {
+  kind: 'metric' | 'slo' | 'alerts'
+  name: string
+  value?: number
+  passed: boolean
+  message?: string
+}
+
+export interface CanaryAnalysis {
+  at: string
+  step: number
+  weight: number
+  passed: boolean
+  checks: CanaryCheck[]
+}
+
+export interface CanaryRollout {
+  id: string
+  userId: string
+  clusterId: string
+  namespace: string
+  deployment: string
+  container: string
+  image: string
+  previous?: string // The stable image
+  strategy: CanaryStrategy
+  traffic: CanaryTraffic
+  service: string
+  ingress?: string
+  steps: CanaryStep[]
+  metrics: CanaryMetric[]
+  sloIds: string[]
+  alertSeverity?: 'info' | 'warning' | 'critical'
+  analysisInterval: number // Seconds
+  failureLimit: number
+  progressTimeout: number // Seconds
+  status: CanaryRolloutStatus
+  step: number
+  weight: number
+  stableReplicas: number
+  stableHash?: string
+  failures: number
+  analyses: CanaryAnalysis[]
+  action?: 'promote' | 'promote_full' | 'abort'
+  actionBy?: string
+  message?: string
+  createdBy?: string
+  stepStartedAt?: string
+  shiftedAt?: string
+  lastAnalysisAt?: string
+  startedAt: string
+  finishedAt?: string
+  updatedAt: string
+}
+
+export interface CreateCanaryRolloutRequest {
+  clusterId: string
+  namespace: string
+  deployment: string
+  container?: string
+  image: string
+  strategy: CanaryStrategy
+  traffic: CanaryTraffic
+  service: string
+  ingress?: string
+  steps?: CanaryStep[] // 10, 25, 50 and 100% for five minutes each when empty
+  metrics?: CanaryMetric[]
+  sloIds?: string[]
+  alertSeverity?: 'info' | 'warning' | 'critical'
+  analysisInterval?: number
+  failureLimit?: number
+  progressTimeout?: number
+}
@@ -0,0 +1,70 @@
+// Certificate expiry monitoring types
+
+export type CertificateSource = 'endpoint' | 'ingress' | 'kubeconfig'
+export type CertificateStatus = 'valid' | 'warning' | 'critical' | 'expired' | 'error' | 'unknown'
+
+export interface Certificate {
+  id: string
+  userId: string
+  source: CertificateSource
+  name: string
+  host?: string
+  port?: number
+  serverName?: string // SNI; the host when empty
+  clusterId?: string
+  namespace?: string
+  resource?: string // Ingress and secret, or kubeconfig context and role
+  subject?: string
+  issuer?: string
+  dnsNames?: string // Comma separated
+  serial?: string
+  fingerprint?: string // SHA-256
+  notBefore?: string
+  notAfter?: string
+  verifyError?: string // Why an endpoint certificate is not trusted
+  warningDays?: number // 0 uses the certificates.expiry_warning setting
+  criticalDays?: number // 0 uses the certificates.expiry_critical setting
+  enabled: boolean
+  status: CertificateStatus
+  lastError?: string
+  lastCheckedAt?: string
+  createdAt: string
+  updatedAt: string
+  expiresIn?: number // seconds; negative once expired
+}
+
+export interface CreateCertificateRequest {
+  name?: string
+  host: string
+  port?: number
+  serverName?: string
+  warningDays?: number
+  criticalDays?: number
+}
+
+export interface UpdateCertificateRequest {
+  name?: string
+  host?: string
+  port?: number
+  serverName?: string
+  warningDays?: number
+  criticalDays?: number
+  enabled?: boolean
+}
+
+export interface CertificateListParams {
+  source?: CertificateSource
+  status?: CertificateStatus
+  clusterId?: string
+  search?: string
+  page?: number
+  pageSize?: number
+}
+
+export interface CertificateList {
+  data: Certificate[]
+  total: number
+  page: number
+  pageSize: number
+  summary: Partial<Record<CertificateStatus, number>>
+}
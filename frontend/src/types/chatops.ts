@@ -0,0 +1,35 @@
+// ChatOps integration types
+
+export type ChatProvider = 'slack' | 'teams'
+
+export interface ChatOpsIntegration {
+  id: string
+  userId: string
+  name: string
+  provider: ChatProvider
+  teamId?: string // Slack team ID or Teams tenant ID commands must come from
+  enabled: boolean
+  lastCommandAt?: string
+  createdAt: string
+  updatedAt: string
+}
+
+export interface ChatOpsIntegrationRequest {
+  name?: string
+  provider?: ChatProvider
+  teamId?: string
+  signingSecret?: string // Slack signing secret, or Teams outgoing webhook security token
+  enabled?: boolean
+}
+
+export interface ChatUserLink {
+  id: string
+  integrationId: string
+  externalUserId: string
+  externalName?: string
+  userId?: string // Empty until the link code is confirmed
+  linkedAt?: string
+  integration?: ChatOpsIntegration
+  createdAt: string
+  updatedAt: string
+}
@@ -40,6 +40,7 @@ export interface ClusterNode {
   memoryAllocatable: string
   storageAllocatable: string
   podCount: number
+  unschedulable: boolean // Cordoned
   conditions: string
   createdAt: string
   updatedAt: string
@@ -100,3 +101,67 @@ export interface ListClustersResponse {
   page: number
   pageSize: number
 }
+
+export interface IssueKubeconfigRequest {
+  namespace?: string // Cluster-wide when empty
+  ttlMinutes?: number
+}
+
+export interface DrainNodeRequest {
+  gracePeriodSeconds?: number // The pods' own grace period when empty
+  ignoreDaemonSets: boolean
+  deleteEmptyDirData: boolean
+  force: boolean // Evict pods no controller will recreate
+  timeoutSeconds?: number
+}
+
+// What a drain evicted and left running, the result of its operation
+export interface DrainNodeResult {
+  node: string
+  evicted: string[]
+  skipped?: string[]
+}
+
+// A time-limited kubeconfig carrying the user's permissions on a cluster
+export interface ScopedKubeconfig {
+  kubeconfig: string
+  serviceAccount: string
+  namespace?: string
+  permissions: string[]
+  expiresAt: string
+}
+
+export type UpgradeAssessmentStatus = 'pending' | 'completed' | 'failed'
+
+// An object or Helm release manifest using a deprecated API version
+export interface DeprecatedAPIFinding {
+  severity: 'critical' | 'warning' // critical when the target version no longer serves the API
+  source: 'live' | 'helm'
+  apiVersion: string
+  kind: string
+  name: string
+  namespace?: string
+  release?: string // Helm release, namespace/name
+  manager?: string // Field manager that wrote the version, for live objects
+  deprecatedIn: string
+  removedIn: string
+  replacement?: string
+  notes?: string
+}
+
+// A scan of a cluster for the deprecated APIs an upgrade to targetVersion affects
+export interface ClusterUpgradeAssessment {
+  id: string
+  clusterId: string
+  clusterName: string
+  triggeredBy?: string
+  currentVersion: string
+  targetVersion: string
+  status: UpgradeAssessmentStatus
+  critical: number
+  warnings: number
+  error?: string
+  completedAt?: string
+  createdAt: string
+  findings?: DeprecatedAPIFinding[] // Only on single assessments
+}
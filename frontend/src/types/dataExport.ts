@@ -0,0 +1,42 @@
+// Raw data export types
+
+export type DataExportDataset = 'hosts' | 'host_metrics' | 'cluster_metrics' | 'alerts'
+export type DataExportFormat = 'csv' | 'parquet'
+export type DataExportStatus = 'pending' | 'completed' | 'failed'
+
+export interface DataExport {
+  id: string
+  userId: string
+  dataset: DataExportDataset
+  format: DataExportFormat
+  from?: string // Time-series datasets only
+  to?: string
+  clusterId?: string
+  hostIds?: string[]
+  status: DataExportStatus
+  rows: number
+  sizeBytes: number
+  error?: string
+  expiresAt?: string // When the file is deleted; set once completed
+  completedAt?: string
+  createdAt: string
+  downloadUrl?: string // Signed link, relative to the API
+  downloadExpiresAt?: string
+}
+
+// The time-series datasets cover the last day when from and to are empty
+export interface CreateDataExportRequest {
+  dataset: DataExportDataset
+  format?: DataExportFormat
+  from?: string
+  to?: string
+  clusterId?: string
+  hostIds?: string[]
+}
+
+export interface ListDataExportsResponse {
+  data: DataExport[]
+  total: number
+  page: number
+  pageSize: number
+}
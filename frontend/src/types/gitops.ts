@@ -0,0 +1,100 @@
+// GitOps types
+
+export type GitOpsAuthType = 'none' | 'basic' | 'ssh'
+export type GitOpsSourceStatus = 'pending' | 'syncing' | 'synced' | 'out_of_sync' | 'failed'
+export type GitOpsResourceState = 'synced' | 'drifted' | 'missing' | 'orphaned' | 'failed'
+
+export interface GitOpsResource {
+  apiVersion: string
+  kind: string
+  namespace?: string
+  name: string
+  state: GitOpsResourceState
+  drift?: string[] // Fields whose live values differ from the manifest
+  message?: string
+}
+
+export interface GitOpsSource {
+  id: string
+  userId: string
+  name: string
+  description?: string
+  repoUrl: string
+  branch: string
+  path: string
+  authType: GitOpsAuthType
+  username?: string
+  clusterId: string
+  namespace?: string
+  autoSync: boolean
+  prune: boolean
+  selfHeal: boolean
+  syncInterval: number // Seconds
+  status: GitOpsSourceStatus
+  revision?: string // Commit the last successful sync applied
+  headRevision?: string
+  resources: GitOpsResource[] | null
+  message?: string
+  lastSyncAt?: string
+  checkedAt?: string
+  nextCheckAt: string
+  createdBy?: string
+  createdAt: string
+  updatedAt: string
+}
+
+export type GitOpsSyncTrigger = 'auto' | 'self_heal' | 'manual' | 'rollback'
+export type GitOpsSyncStatus = 'running' | 'succeeded' | 'failed'
+export type GitOpsSyncAction = 'created' | 'configured' | 'unchanged' | 'pruned' | 'failed'
+
+export interface GitOpsSyncedResource {
+  apiVersion: string
+  kind: string
+  namespace?: string
+  name: string
+  action: GitOpsSyncAction
+  message?: string
+}
+
+export interface GitOpsSync {
+  id: string
+  sourceId: string
+  trigger: GitOpsSyncTrigger
+  revision: string
+  commitMessage?: string
+  commitAuthor?: string
+  status: GitOpsSyncStatus
+  applied: number
+  pruned: number
+  failed: number
+  resources: GitOpsSyncedResource[] | null
+  message?: string
+  triggeredBy?: string
+  startedAt: string
+  finishedAt?: string
+}
+
+export interface CreateGitOpsSourceRequest {
+  name: string
+  description?: string
+  repoUrl: string
+  branch?: string // main when empty
+  path?: string
+  authType?: GitOpsAuthType
+  username?: string
+  password?: string // Password or access token
+  sshKey?: string
+  clusterId: string
+  namespace?: string
+  autoSync?: boolean
+  prune?: boolean
+  selfHeal?: boolean
+  syncInterval?: number
+}
+
+export type UpdateGitOpsSourceRequest = Partial<Omit<CreateGitOpsSourceRequest, 'clusterId'>>
+
+export interface SyncGitOpsSourceRequest {
+  revision?: string // Commit to apply; the head of the branch when empty
+  prune?: boolean
+}
@@ -1,5 +1,8 @@
 // Host types
-export type HostStatus = 'pending' | 'approved' | 'rejected' | 'offline' | 'online'
+export type HostStatus = 'pending' | 'approved' | 'rejected' | 'offline' | 'online' | 'degraded'
+
+// Where a host is in its life, independently of its agent reporting
+export type HostLifecycle = 'provisioning' | 'active' | 'maintenance' | 'decommissioning' | 'retired'
 
 export interface Host {
   id: string
@@ -7,6 +10,9 @@ export interface Host {
   ipAddress: string
   port: number
   status: HostStatus
+  lifecycle: HostLifecycle
+  lifecycleChangedAt?: string
+  agentTokenRevokedAt?: string
   osType: string
   osVersion: string
   cpuCores: number | null
@@ -15,6 +21,7 @@ export interface Host {
   labels: Record<string, string>
   tags: string[]
   clusterId: string | null
+  group: string
   registeredBy: string
   approvedBy: string | null
   approvedAt: string | null
@@ -46,6 +53,7 @@ export interface CreateHostRequest {
   labels: Record<string, string>
   tags: string[]
   clusterId: string
+  group?: string
 }
 
 export interface UpdateHostRequest {
@@ -59,14 +67,17 @@ export interface UpdateHostRequest {
   labels?: Record<string, string>
   tags?: string[]
   clusterId?: string
+  group?: string
 }
 
 export interface HostListParams {
   page?: number
   pageSize?: number
   status?: HostStatus
+  lifecycle?: HostLifecycle | HostLifecycle[]
   hostname?: string
   ipAddress?: string
+  group?: string
   registeredBy?: string
   labels?: Record<string, string>
   tags?: string[]
@@ -84,3 +95,116 @@ export interface HostListResponse {
 export interface RejectHostRequest {
   reason?: string
 }
+
+// Bulk host actions. delete and retire wait for another user's approval.
+export type HostBulkAction = 'delete' | 'retire' | 'tags' | 'labels' | 'agent_config' | 'move'
+
+export interface AgentConfigUpdate {
+  reportInterval?: number // seconds
+  heartbeatInterval?: number // seconds
+  commandPollInterval?: number // seconds
+  collectNetwork?: boolean
+}
+
+export interface HostBulkRequest {
+  hostIds: string[]
+  addTags?: string[]
+  removeTags?: string[]
+  setLabels?: Record<string, string>
+  removeLabels?: string[]
+  agentConfig?: AgentConfigUpdate
+  group?: string // move; empty moves the hosts out of their group
+  reason?: string
+}
+
+export interface HostBulkItemResult {
+  hostId: string
+  status: 'succeeded' | 'failed'
+  error?: string
+  commandId?: string
+}
+
+export interface HostBulkResult {
+  action: HostBulkAction
+  succeeded: number
+  failed: number
+  items: HostBulkItemResult[]
+}
+
+export type HostBulkApprovalStatus = 'pending' | 'approved' | 'rejected' | 'expired'
+
+export interface HostBulkApproval {
+  id: string
+  action: HostBulkAction
+  request: HostBulkRequest
+  status: HostBulkApprovalStatus
+  requestedBy: string
+  reviewedBy?: string
+  reviewComment?: string
+  reviewedAt?: string
+  result?: HostBulkResult
+  expiresAt: string
+  createdAt: string
+  updatedAt: string
+}
+
+export interface HostBulkApprovalList {
+  data: HostBulkApproval[]
+  total: number
+  page: number
+  pageSize: number
+  totalPages: number
+}
+
+export interface HostLifecycleEvent {
+  id: string
+  hostId: string
+  from: HostLifecycle
+  to: HostLifecycle
+  reason?: string
+  userId?: string
+  createdAt: string
+}
+
+export interface HostLifecycleInfo {
+  lifecycle: HostLifecycle
+  transitions: HostLifecycle[]
+  history: HostLifecycleEvent[]
+}
+
+// Moving a host to decommissioning or retired decommissions it
+export interface HostLifecycleRequest {
+  lifecycle: HostLifecycle
+  reason?: string
+}
+
+// A new agent token, shown only once
+export interface HostAgentToken {
+  hostId: string
+  token: string
+}
+
+// What a decommissioned host leaves; the history is left out of lists
+export interface HostArchive {
+  id: string
+  hostId: string
+  hostname: string
+  ipAddress: string
+  history?: {
+    host: Host
+    lifecycle: HostLifecycleEvent[]
+    commands: Record<string, unknown>[]
+    alerts: Record<string, unknown>[]
+    events: Record<string, unknown>[]
+  }
+  archivedBy?: string
+  archivedAt: string
+}
+
+export interface HostArchiveList {
+  data: HostArchive[]
+  total: number
+  page: number
+  pageSize: number
+  totalPages: number
+}
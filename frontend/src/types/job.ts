@@ -0,0 +1,50 @@
+// Background job queue types
+
+export type JobStatus = 'queued' | 'running' | 'succeeded' | 'dead'
+
+export interface Job {
+  id: string
+  type: string
+  priority: number
+  payload?: unknown
+  status: JobStatus
+  attempts: number
+  maxAttempts: number
+  runAt: string
+  lockedUntil?: string
+  lockedBy?: string
+  lastError?: string
+  durationMs: number
+  completedAt?: string
+  createdAt: string
+  updatedAt: string
+}
+
+// Jobs of a type by status, and attempt counts of the answering instance
+export interface JobTypeStats {
+  type: string
+  registered: boolean
+  queued: number
+  running: number
+  succeeded: number
+  dead: number
+  oldestQueuedAt?: string
+  enqueued: number
+  attempts: number
+  failures: number
+  avgDurationMs: number
+}
+
+export interface ListJobsParams {
+  type?: string
+  status?: JobStatus
+  page?: number
+  pageSize?: number
+}
+
+export interface ListJobsResponse {
+  data: Job[]
+  total: number
+  page: number
+  pageSize: number
+}
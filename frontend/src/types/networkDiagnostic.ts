@@ -0,0 +1,108 @@
+// Network diagnostics run from host agents
+
+export type NetworkDiagnosticType = 'dns' | 'traceroute' | 'mtr' | 'tcp' | 'bandwidth'
+export type NetworkDiagnosticStatus = 'running' | 'completed' | 'failed'
+export type DNSRecordType = 'A' | 'AAAA' | 'CNAME' | 'MX' | 'NS' | 'TXT' | 'PTR'
+
+export interface DNSRecord {
+  type: DNSRecordType
+  value: string
+}
+
+export interface DNSLookupResult {
+  server?: string // The resolver asked; empty for the host's
+  recordType: DNSRecordType
+  records: DNSRecord[]
+  latency: number // ms
+  trace?: string // Output of dig +trace
+  error?: string // Why the name did not resolve
+}
+
+export interface TraceHop {
+  hop: number
+  address?: string // Empty when the hop did not answer
+  hostname?: string
+  sent: number
+  loss: number // percent
+  last?: number // ms
+  best?: number
+  avg?: number
+  worst?: number
+}
+
+export interface TraceResult {
+  hops: TraceHop[]
+  reached: boolean
+  output?: string
+}
+
+export interface TCPConnectAttempt {
+  latency: number // ms
+  error?: string
+}
+
+export interface TCPConnectResult {
+  address?: string
+  attempts: TCPConnectAttempt[]
+  succeeded: number
+}
+
+export interface BandwidthResult {
+  bytes: number
+  seconds: number
+  bitsPerSecond: number
+}
+
+export type NetworkDiagnosticResult = DNSLookupResult | TraceResult | TCPConnectResult | BandwidthResult
+
+export interface NetworkDiagnostic {
+  id: string
+  userId: string
+  hostId: string
+  hostName: string
+  type: NetworkDiagnosticType
+  target: string // The peer's address for bandwidth tests
+  peerHostId?: string
+  peerHostName?: string
+  options?: Record<string, unknown>
+  status: NetworkDiagnosticStatus
+  summary?: string
+  result?: NetworkDiagnosticResult // Only returned by get
+  error?: string
+  operationId?: string
+  duration: number // ms
+  startedAt: string
+  completedAt?: string
+  createdAt: string
+}
+
+// Options that do not apply to the type are ignored
+export interface RunNetworkDiagnosticRequest {
+  hostId: string
+  type: NetworkDiagnosticType
+  target?: string // Not used by bandwidth tests
+  port?: number // tcp, and bandwidth where it defaults to 5201
+  recordType?: DNSRecordType // dns; A when omitted
+  server?: string // dns; the host's resolver when omitted
+  trace?: boolean // dns: trace the delegation from the root
+  count?: number // mtr cycles (10) or tcp attempts (3)
+  maxHops?: number // traceroute and mtr; 30 when omitted
+  peerHostId?: string // bandwidth: the host receiving the traffic
+  duration?: number // bandwidth: seconds of traffic; 10 when omitted
+}
+
+export interface NetworkDiagnosticListParams {
+  hostId?: string // Run from or to the host
+  type?: NetworkDiagnosticType
+  status?: NetworkDiagnosticStatus
+  search?: string // Matches the target
+  page?: number
+  pageSize?: number
+}
+
+export interface NetworkDiagnosticList {
+  data: NetworkDiagnostic[]
+  total: number
+  page: number
+  pageSize: number
+}
@@ -5,6 +5,10 @@ export type NotificationPriority = 'low' | 'medium' | 'high' | 'critical'
 
 export type NotificationStatus = 'pending' | 'sent' | 'failed' | 'delivered'
 
+export type NotificationSource = 'alerts' | 'batch_tasks' | 'ai' | 'hosts' | 'clusters' | 'system' | 'reports' | 'certificates' | 'helm'
+
+export type NotificationAction = 'read' | 'unread' | 'archive' | 'unarchive' | 'delete'
+
 export interface Notification {
   id: string
   userId: string
@@ -13,8 +17,11 @@ export interface Notification {
   message: string
   priority: NotificationPriority
   status: NotificationStatus
+  source: NotificationSource
   read: boolean
   readAt?: string
+  archived: boolean
+  archivedAt?: string
   actionUrl?: string
   actionLabel?: string
   metadata?: Record<string, string>
@@ -34,10 +41,42 @@ export interface NotificationPreference {
   quietHoursStart: string
   quietHoursEnd: string
   timezone: string
+  webDigest: DigestMode
+  emailDigest: DigestMode
+  digestHour: number
+  immediatePriority: NotificationPriority
   createdAt: string
   updatedAt: string
 }
 
+export type DigestMode = 'off' | 'hourly' | 'daily'
+
+export type NotificationOutcome = 'immediate' | 'digest' | 'quiet_hours' | 'skipped'
+
+export interface NotificationChannelPreview {
+  mode: DigestMode
+  immediate: number
+  digested: number
+  quietHours: number
+  skipped: number
+  nextDigestAt?: string
+}
+
+export interface NotificationPreviewItem {
+  notificationId: string
+  title: string
+  type: NotificationType
+  priority: NotificationPriority
+  createdAt: string
+  channels: Record<'web' | 'email', NotificationOutcome>
+}
+
+export interface NotificationDigestPreview {
+  since: string
+  channels: Record<'web' | 'email', NotificationChannelPreview>
+  items: NotificationPreviewItem[]
+}
+
 export interface NotificationStats {
   total: number
   unread: number
@@ -68,3 +107,36 @@ export interface NotificationStatsResponse {
 export interface NotificationPreferenceResponse {
   data: NotificationPreference
 }
+
+export interface NotificationDigestPreviewResponse {
+  data: NotificationDigestPreview
+}
+
+// Filter of the cursor-paged notification search
+export interface NotificationSearchParams {
+  q?: string
+  sources?: NotificationSource[]
+  types?: NotificationType[]
+  priorities?: NotificationPriority[]
+  read?: boolean
+  archived?: boolean
+  cursor?: string
+  limit?: number
+}
+
+export interface NotificationPage {
+  notifications: Notification[]
+  nextCursor?: string
+}
+
+export interface NotificationPageResponse {
+  data: NotificationPage
+}
+
+// Data of notification.updated events, sent when another session changes
+// notifications; ids is empty when the action applied to all of them
+export interface NotificationsUpdate {
+  action: NotificationAction
+  ids?: string[]
+  unreadCount: number
+}
@@ -0,0 +1,49 @@
+// Long-running operation types
+
+export type OperationType = 'host.scan' | 'batch_task.execute' | 'grafana.sync' | 'network.diagnostic' | 'node.drain'
+
+export type OperationStatus = 'pending' | 'running' | 'succeeded' | 'failed' | 'cancelled'
+
+// Work that outlives the request starting it, polled until its status is done
+export interface Operation<T = unknown> {
+  id: string
+  userId: string
+  type: OperationType
+  status: OperationStatus
+  progress: number
+  message?: string
+  resourceType?: string
+  resourceId?: string
+  result?: T
+  error?: string
+  cancellable: boolean
+  cancelRequested: boolean
+  startedAt?: string
+  completedAt?: string
+  createdAt: string
+  updatedAt: string
+}
+
+// The 202 Accepted body of a request that started an operation
+export interface OperationAccepted<T = unknown> {
+  operationId: string
+  status: OperationStatus
+  location: string
+  operation: Operation<T>
+}
+
+export interface ListOperationsParams {
+  type?: OperationType
+  status?: OperationStatus
+  resourceId?: string
+  active?: boolean
+  page?: number
+  pageSize?: number
+}
+
+export interface ListOperationsResponse {
+  data: Operation[]
+  total: number
+  page: number
+  pageSize: number
+}
@@ -0,0 +1,95 @@
+// Deployment pipeline types
+
+export type PipelineTargetType = 'deployment' | 'helm'
+export type PipelineRunTrigger = 'webhook' | 'manual'
+export type PipelineRunStatus = 'running' | 'succeeded' | 'failed' | 'rolled_back'
+
+export interface DeploymentPipeline {
+  id: string
+  userId: string
+  name: string
+  description?: string
+  clusterId: string
+  namespace: string
+  targetType: PipelineTargetType
+  deployment?: string
+  container?: string // The deployment's only container when empty
+  releaseId?: string
+  valuesKey?: string // Dotted values key Helm pipelines set the tag at
+  imageRepository?: string // The container's current repository when empty
+  tagPattern?: string // Regular expression tags must match
+  rolloutTimeout: number // Seconds
+  rollbackOnFailure: boolean
+  callbackUrl?: string
+  enabled: boolean
+  lastTag?: string
+  lastStatus?: PipelineRunStatus
+  lastRunAt?: string
+  createdBy?: string
+  createdAt: string
+  updatedAt: string
+}
+
+// Returned when a pipeline is created or its secret rotated; the secret cannot be read again
+export interface DeploymentPipelineSecret extends DeploymentPipeline {
+  secret: string
+}
+
+export interface PipelineRollout {
+  name: string
+  replicas: number
+  updated: number
+  available: number
+  done: boolean
+  message?: string
+}
+
+export interface DeploymentPipelineRun {
+  id: string
+  pipelineId: string
+  trigger: PipelineRunTrigger
+  tag: string
+  image?: string
+  previous?: string // The image or values tag the run replaced
+  commit?: string
+  ref?: string
+  buildUrl?: string
+  status: PipelineRunStatus
+  rollouts: PipelineRollout[] | null
+  message?: string
+  callbackStatus?: number
+  callbackError?: string
+  triggeredBy?: string
+  startedAt: string
+  finishedAt?: string
+}
+
+export interface CreateDeploymentPipelineRequest {
+  name: string
+  description?: string
+  clusterId: string
+  namespace?: string // Helm pipelines take their release's
+  targetType: PipelineTargetType
+  deployment?: string
+  container?: string
+  releaseId?: string
+  valuesKey?: string
+  imageRepository?: string
+  tagPattern?: string
+  rolloutTimeout?: number
+  rollbackOnFailure?: boolean
+  callbackUrl?: string
+  secret?: string // Generated when empty
+  enabled?: boolean
+}
+
+export type UpdateDeploymentPipelineRequest = Partial<
+  Omit<CreateDeploymentPipelineRequest, 'clusterId' | 'targetType' | 'secret'>
+>
+
+export interface TriggerDeploymentPipelineRequest {
+  tag: string
+  commit?: string
+  ref?: string
+  buildUrl?: string
+}
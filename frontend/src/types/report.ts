@@ -0,0 +1,126 @@
+// Scheduled report types
+
+export type ReportSection = 'host_availability' | 'alert_summary' | 'top_anomalies' | 'cluster_capacity'
+export type ReportFormat = 'pdf' | 'csv'
+export type ReportStatus = 'pending' | 'completed' | 'failed'
+
+export interface ReportTemplate {
+  name: string
+  title: string
+  description: string
+  sections: ReportSection[]
+}
+
+export interface ReportSchedule {
+  id: string
+  name: string
+  template: string
+  format: ReportFormat
+  schedule: string // crontab(5) schedule, e.g. 0 8 * * 1
+  window: number // seconds
+  recipients: string[] // The creator when empty
+  enabled: boolean
+  createdBy: string
+  lastRunAt?: string
+  nextRunAt?: string // Empty when disabled
+  createdAt: string
+  updatedAt: string
+}
+
+export interface ReportHostAvailability {
+  hostId: string
+  hostname: string
+  status: string
+  outages: number
+  downtimeSeconds: number
+  availability: number // percent
+}
+
+export interface ReportAlertCount {
+  severity: string
+  fired: number
+  resolved: number
+}
+
+export interface ReportAnomaly {
+  id: string
+  severity: string
+  metricName: string
+  hostId?: string
+  clusterId?: string
+  currentValue: number
+  deviation: number
+  description: string
+  detectedAt: string
+}
+
+export interface ReportClusterCapacity {
+  clusterId: string
+  name: string
+  samples: number
+  avgCpuPercent: number
+  maxCpuPercent: number
+  avgMemoryPercent: number
+  maxMemoryPercent: number
+  nodes: number
+  pods: number
+}
+
+export interface ReportData {
+  sections: ReportSection[]
+  hostAvailability?: ReportHostAvailability[]
+  alertSummary?: ReportAlertCount[]
+  topAnomalies?: ReportAnomaly[]
+  clusterCapacity?: ReportClusterCapacity[]
+}
+
+export interface Report {
+  id: string
+  scheduleId?: string
+  triggeredBy?: string
+  title: string
+  template: string
+  format: ReportFormat
+  periodStart: string
+  periodEnd: string
+  status: ReportStatus
+  error?: string
+  completedAt?: string
+  createdAt: string
+  data?: ReportData // Only when fetched one at a time
+}
+
+export interface CreateReportScheduleRequest {
+  name: string
+  template: string
+  format?: ReportFormat
+  schedule: string
+  window?: number
+  recipients?: string[]
+  enabled?: boolean
+}
+
+export type UpdateReportScheduleRequest = Partial<CreateReportScheduleRequest>
+
+export interface GenerateReportRequest {
+  template: string
+  format?: ReportFormat
+  window?: number
+  recipients?: string[] // The requester when empty
+}
+
+export interface ListReportsParams {
+  scheduleId?: string
+  status?: ReportStatus
+  since?: string
+  until?: string
+  page?: number
+  pageSize?: number
+}
+
+export interface ListReportsResponse {
+  data: Report[]
+  total: number
+  page: number
+  pageSize: number
+}
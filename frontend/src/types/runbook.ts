@@ -0,0 +1,49 @@
+// Runbook types
+
+export type RunbookAction = 'batch_task' | 'restart_deployment' | 'scale_deployment'
+export type RunbookTrigger = 'auto' | 'manual'
+export type RunbookExecutionStatus = 'running' | 'succeeded' | 'failed' | 'skipped'
+
+export interface Runbook {
+  id: string
+  userId: string
+  ruleId: string
+  name: string
+  description: string
+  action: RunbookAction
+  trigger: RunbookTrigger
+  enabled: boolean
+  taskTemplateId?: string
+  alertHostOnly: boolean
+  clusterId?: string
+  namespace?: string
+  deployment?: string
+  scaleBy?: number
+  maxReplicas?: number
+  cooldown: number // seconds between runs
+  maxPerHour: number // 0 = no limit
+  createdAt: string
+  updatedAt: string
+}
+
+export interface RunbookExecution {
+  id: string
+  runbookId: string
+  ruleId: string
+  alertId: string
+  userId: string
+  trigger: RunbookTrigger
+  triggeredBy?: string
+  status: RunbookExecutionStatus
+  message: string
+  batchTaskId?: string
+  startedAt: string
+  completedAt?: string
+}
+
+export interface RunbookExecutionsResponse {
+  data: RunbookExecution[]
+  total: number
+  page: number
+  pageSize: number
+}
@@ -0,0 +1,38 @@
+// Global inventory search types
+
+export type SearchResultType =
+  | 'host'
+  | 'cluster'
+  | 'pod'
+  | 'deployment'
+  | 'dashboard'
+  | 'alert_rule'
+  | 'helm_release'
+
+export interface SearchResult {
+  type: SearchResultType
+  id: string // UUID, or namespace/name for pods and deployments
+  name: string
+  description?: string
+  clusterId?: string
+  clusterName?: string
+  namespace?: string
+  status?: string
+  label?: string // The key=value that matched, for label searches
+  link: string // Route of the resource, or a URL when external
+  external?: boolean
+  score: number
+}
+
+export interface SearchResponse {
+  query: string
+  results: SearchResult[] // Grouped by type, best first within a type
+  indexing: boolean // Some clusters are not indexed yet, so pods and deployments may be missing
+  took: number // ms
+}
+
+export interface SearchParams {
+  q: string // A name, or key=value to match labels; a value ending in * matches by prefix
+  types?: string // Comma separated SearchResultType values
+  limit?: number // Results per type
+}
@@ -0,0 +1,70 @@
+// Service level objective types
+
+export type SLOStatus = 'met' | 'at_risk' | 'breached' | 'unknown'
+export type SLOSeverity = 'info' | 'warning' | 'critical'
+
+export interface SLOBurnRateAlert {
+  ruleId: string // The alert rule fired through the alert pipeline
+  severity: SLOSeverity
+  factor: number
+  longWindow: number // seconds
+  shortWindow: number // seconds
+  longBurnRate?: number
+  shortBurnRate?: number
+}
+
+export interface SLO {
+  id: string
+  userId: string
+  name: string
+  description: string
+  dataSourceId: string
+  goodQuery: string // Count of good events over $window
+  totalQuery: string // Count of all events over $window
+  objective: number // percent, e.g. 99.9
+  window: number // seconds
+  burnRateAlerts: SLOBurnRateAlert[]
+  enabled: boolean
+  status: SLOStatus
+  sli?: number // percent over the window
+  errorBudgetRemaining?: number // percent; negative when overspent
+  lastEvaluatedAt?: string
+  lastError?: string
+  createdAt: string
+  updatedAt: string
+}
+
+export interface SLOBurnRateAlertRequest {
+  severity: SLOSeverity
+  factor: number
+  longWindow: number
+  shortWindow: number
+}
+
+export interface CreateSLORequest {
+  name: string
+  description?: string
+  dataSourceId: string
+  goodQuery: string
+  totalQuery: string
+  objective: number
+  window?: number // seconds; 30 days when omitted
+  burnRateAlerts?: SLOBurnRateAlertRequest[] // The default multi-window tiers when omitted
+  enabled?: boolean
+}
+
+export type UpdateSLORequest = Partial<CreateSLORequest>
+
+export interface SLOHistoryPoint {
+  timestamp: string
+  sli: number
+  errorBudgetRemaining: number
+}
+
+export interface SLOHistory {
+  sloId: string
+  start: string
+  end: string
+  step: number // seconds
+  points: SLOHistoryPoint[]
+}
@@ -0,0 +1,97 @@
+// Synthetic check types
+
+export type SyntheticCheckType = 'http' | 'tcp' | 'icmp'
+export type SyntheticCheckStatus = 'up' | 'degraded' | 'down' | 'unknown'
+export type SyntheticSeverity = 'info' | 'warning' | 'critical'
+
+// The location of probes run by the gateway; other locations are host IDs
+export const SYNTHETIC_LOCATION_GATEWAY = 'gateway'
+
+export interface SyntheticCheck {
+  id: string
+  userId: string
+  name: string
+  type: SyntheticCheckType
+  target: string // URL, host:port or host
+  method?: string
+  interval: number // seconds
+  timeout: number // seconds
+  locations: string[]
+  expectedStatus?: string // e.g. 200-299,301
+  bodyRegex?: string
+  maxLatency?: number // milliseconds
+  failureThreshold: number // Failing locations that make the check down
+  severity: SyntheticSeverity
+  alertRuleId: string
+  enabled: boolean
+  status: SyntheticCheckStatus
+  failingCount: number
+  lastLatency?: number // milliseconds
+  lastError?: string
+  lastCheckedAt?: string
+  nextRunAt?: string
+  createdAt: string
+  updatedAt: string
+}
+
+export interface CreateSyntheticCheckRequest {
+  name: string
+  type: SyntheticCheckType
+  target: string
+  method?: string
+  interval?: number
+  timeout?: number
+  locations?: string[]
+  expectedStatus?: string
+  bodyRegex?: string
+  maxLatency?: number
+  failureThreshold?: number
+  severity?: SyntheticSeverity
+  enabled?: boolean
+}
+
+export type UpdateSyntheticCheckRequest = Partial<Omit<CreateSyntheticCheckRequest, 'type'>>
+
+export interface SyntheticResult {
+  id: string
+  checkId: string
+  location: string
+  success: boolean
+  latency: number // milliseconds
+  statusCode?: number
+  error?: string
+  checkedAt: string
+}
+
+export interface SyntheticResultParams {
+  location?: string
+  success?: boolean
+  start?: string
+  end?: string
+  page?: number
+  pageSize?: number
+}
+
+export interface SyntheticResultList {
+  data: SyntheticResult[]
+  total: number
+  page: number
+  pageSize: number
+}
+
+export interface SyntheticLocationUptime {
+  location: string
+  probes: number
+  successes: number
+  uptime: number // percent
+  avgLatency: number // milliseconds
+  maxLatency: number
+}
+
+export interface SyntheticUptime {
+  checkId: string
+  since: string
+  until: string
+  overall: SyntheticLocationUptime // The share of runs the check was not down
+  locations: SyntheticLocationUptime[]
+}
@@ -0,0 +1,29 @@
+// Resource tag types
+
+export type TagResourceType = 'cluster' | 'data_source' | 'dashboard' | 'alert_rule' | 'helm_release'
+
+// Tags of a resource by key
+export type Tags = Record<string, string>
+
+export interface TaggedResource {
+  type: TagResourceType
+  id: string
+}
+
+export interface BulkTagRequest {
+  resources: TaggedResource[]
+  add?: Tags
+  remove?: string[] // Keys
+}
+
+export interface BulkTagResult {
+  updated: number
+  failed?: { resource: TaggedResource; error: string }[]
+}
+
+// A tag key in use, for suggesting tags and filters
+export interface TagKey {
+  key: string
+  values: string[]
+  count: number
+}
@@ -0,0 +1,64 @@
+// Ticketing integration types
+import type { AlertSeverity } from './alert'
+
+export type TicketProvider = 'jira' | 'servicenow'
+export type AlertTicketStatus = 'open' | 'resolved'
+
+export interface TicketIntegration {
+  id: string
+  userId: string
+  name: string
+  provider: TicketProvider
+  baseUrl: string
+  username?: string // Empty sends the token as a bearer token
+  enabled: boolean
+  project?: string // Jira project key, or ServiceNow assignment group
+  issueType?: string // Jira issue type, or ServiceNow table
+  severities: AlertSeverity[] // Every severity when empty
+  summaryTemplate: string
+  descriptionTemplate: string
+  fields: Record<string, string> // Provider field -> Go template
+  resolveTransition?: string // Jira transition name, or ServiceNow state
+  syncStatus: boolean
+  lastSyncedAt?: string
+  createdAt: string
+  updatedAt: string
+}
+
+export interface TicketIntegrationRequest {
+  name?: string
+  provider?: TicketProvider
+  baseUrl?: string
+  username?: string
+  token?: string
+  enabled?: boolean
+  project?: string
+  issueType?: string
+  severities?: AlertSeverity[]
+  summaryTemplate?: string
+  descriptionTemplate?: string
+  fields?: Record<string, string>
+  resolveTransition?: string
+  syncStatus?: boolean
+}
+
+export interface CreatedTicketIntegration {
+  integration: TicketIntegration
+  inboundToken: string // Only returned when created or rotated
+}
+
+export interface AlertTicket {
+  id: string
+  alertId: string
+  integrationId: string
+  provider: TicketProvider
+  externalId: string
+  externalKey: string
+  url: string
+  externalStatus?: string
+  status: AlertTicketStatus
+  lastSyncedAt?: string
+  error?: string
+  createdAt: string
+  updatedAt: string
+}
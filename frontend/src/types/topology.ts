@@ -0,0 +1,58 @@
+// Topology map types
+export type TopologyKind = 'cluster' | 'node' | 'pod' | 'service' | 'host'
+export type TopologyHealth = 'unknown' | 'healthy' | 'warning' | 'critical'
+export type TopologyEdgeKind = 'contains' | 'runs' | 'selects' | 'machine'
+
+export interface TopologyNode {
+  id: string
+  kind: TopologyKind
+  name: string
+  clusterId?: string
+  hostId?: string
+  namespace?: string
+  status: string
+  health: TopologyHealth
+  alerts: number
+  anomalies: number
+  attributes?: Record<string, string>
+}
+
+export interface TopologyEdge {
+  source: string
+  target: string
+  kind: TopologyEdgeKind
+}
+
+export interface TopologySource {
+  clusterId?: string
+  clusterName?: string
+  revision: number
+  builtAt: string
+  error?: string
+}
+
+export interface TopologyGraph {
+  nodes: TopologyNode[]
+  edges: TopologyEdge[]
+  sources: TopologySource[]
+  truncated: boolean
+}
+
+// Change to one source of the map, delivered as topology.changed events
+export interface TopologyDelta {
+  clusterId?: string
+  previousRevision: number
+  revision: number
+  upserted?: TopologyNode[]
+  removed?: string[]
+  addedEdges?: TopologyEdge[]
+  removedEdges?: TopologyEdge[]
+}
+
+export interface TopologyParams {
+  clusterIds?: string[]
+  namespace?: string
+  kinds?: TopologyKind[]
+  health?: TopologyHealth
+  hosts?: boolean
+}
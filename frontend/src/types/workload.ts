@@ -71,14 +71,74 @@ export interface NamespacesResponse {
   data: string[]
 }
 
+// Where a list was served from: the gateway's informer cache of the cluster,
+// or the cluster itself with the reason the cache was bypassed
+export interface CacheFreshness {
+  source: 'cache' | 'cluster'
+  reason?: 'disabled' | 'cold' | 'namespace_excluded' | 'over_limit' | 'stale'
+  syncedAt?: string
+  lastChangeAt?: string
+  resourceVersion?: string
+}
+
 export interface DeploymentsResponse {
   data: K8sDeployment[]
+  cache?: CacheFreshness
 }
 
 export interface PodsResponse {
   data: K8sPod[]
+  cache?: CacheFreshness
 }
 
 export interface ServicesResponse {
   data: K8sService[]
+  cache?: CacheFreshness
+}
+
+export type WatchKind = 'pods' | 'deployments' | 'events'
+
+export interface K8sEventSummary {
+  type: string
+  reason: string
+  message: string
+  kind: string
+  object: string
+  count: number
+  firstSeen: string
+  lastSeen: string
+}
+
+export interface WatchDelta {
+  kind: WatchKind
+  type: 'added' | 'modified' | 'deleted'
+  name: string
+  namespace: string
+  resourceVersion: string
+  labels?: Record<string, string>
+  object: K8sPod | K8sDeployment | K8sEventSummary
+}
+
+export interface WatchParams {
+  clusterId: string
+  namespace: string
+  kinds?: WatchKind[]
+  labelSelector?: string
+  name?: string
+  resourceVersion?: string // Resume from the last delta received
+}
+
+// Messages of the resource watch websocket. After "subscribed" come either the
+// deltas since the requested resourceVersion or "resync" and the current
+// objects, then "synced"; deltas are upserts keyed by kind and name.
+export interface WatchMessage {
+  type: 'subscribe' | 'subscribed' | 'resync' | 'delta' | 'synced' | 'error'
+  kinds?: WatchKind[]
+  denied?: WatchKind[]
+  labelSelector?: string
+  name?: string
+  resourceVersion?: string
+  resumed?: boolean
+  delta?: WatchDelta
+  message?: string
 }
@@ -0,0 +1,173 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies the status into out
+func (in *SyncStatus) DeepCopyInto(out *SyncStatus) {
+	*out = *in
+	if in.LastSyncedAt != nil {
+		out.LastSyncedAt = in.LastSyncedAt.DeepCopy()
+	}
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+}
+
+// DeepCopyInto copies the spec into out
+func (in *MyOpsAlertRuleSpec) DeepCopyInto(out *MyOpsAlertRuleSpec) {
+	*out = *in
+	if in.Enabled != nil {
+		enabled := *in.Enabled
+		out.Enabled = &enabled
+	}
+}
+
+// DeepCopyInto copies the spec into out
+func (in *MyOpsDataSourceSpec) DeepCopyInto(out *MyOpsDataSourceSpec) {
+	*out = *in
+	if in.PasswordSecretRef != nil {
+		ref := *in.PasswordSecretRef
+		out.PasswordSecretRef = &ref
+	}
+	if in.Headers != nil {
+		out.Headers = make(map[string]string, len(in.Headers))
+		for k, v := range in.Headers {
+			out.Headers[k] = v
+		}
+	}
+}
+
+// DeepCopyInto copies the spec into out
+func (in *MyOpsAnomalyRuleSpec) DeepCopyInto(out *MyOpsAnomalyRuleSpec) {
+	*out = *in
+	if in.HostTags != nil {
+		out.HostTags = append([]string(nil), in.HostTags...)
+	}
+	if in.Enabled != nil {
+		enabled := *in.Enabled
+		out.Enabled = &enabled
+	}
+}
+
+// DeepCopyInto copies the resource into out
+func (in *MyOpsAlertRule) DeepCopyInto(out *MyOpsAlertRule) {
+	*out = *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy copies the resource
+func (in *MyOpsAlertRule) DeepCopy() *MyOpsAlertRule {
+	if in == nil {
+		return nil
+	}
+	out := new(MyOpsAlertRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject copies the resource
+func (in *MyOpsAlertRule) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyObject copies the list
+func (in *MyOpsAlertRuleList) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := &MyOpsAlertRuleList{TypeMeta: in.TypeMeta}
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]MyOpsAlertRule, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+	return out
+}
+
+// DeepCopyInto copies the resource into out
+func (in *MyOpsDataSource) DeepCopyInto(out *MyOpsDataSource) {
+	*out = *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy copies the resource
+func (in *MyOpsDataSource) DeepCopy() *MyOpsDataSource {
+	if in == nil {
+		return nil
+	}
+	out := new(MyOpsDataSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject copies the resource
+func (in *MyOpsDataSource) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyObject copies the list
+func (in *MyOpsDataSourceList) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := &MyOpsDataSourceList{TypeMeta: in.TypeMeta}
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]MyOpsDataSource, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+	return out
+}
+
+// DeepCopyInto copies the resource into out
+func (in *MyOpsAnomalyRule) DeepCopyInto(out *MyOpsAnomalyRule) {
+	*out = *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy copies the resource
+func (in *MyOpsAnomalyRule) DeepCopy() *MyOpsAnomalyRule {
+	if in == nil {
+		return nil
+	}
+	out := new(MyOpsAnomalyRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject copies the resource
+func (in *MyOpsAnomalyRule) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyObject copies the list
+func (in *MyOpsAnomalyRuleList) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := &MyOpsAnomalyRuleList{TypeMeta: in.TypeMeta}
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]MyOpsAnomalyRule, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+	return out
+}
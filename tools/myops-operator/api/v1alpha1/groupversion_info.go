@@ -0,0 +1,27 @@
+// Package v1alpha1 contains the MyOps custom resources, platform configuration
+// declared in a management cluster and reconciled against the gateway API
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is the API group and version of the MyOps resources
+	GroupVersion = schema.GroupVersion{Group: "myops.io", Version: "v1alpha1"}
+
+	// SchemeBuilder registers the MyOps resources with a scheme
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the MyOps resources to a scheme
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+func init() {
+	SchemeBuilder.Register(
+		&MyOpsAlertRule{}, &MyOpsAlertRuleList{},
+		&MyOpsDataSource{}, &MyOpsDataSourceList{},
+		&MyOpsAnomalyRule{}, &MyOpsAnomalyRuleList{},
+	)
+}
@@ -0,0 +1,148 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AdoptAnnotation names an existing gateway object that a new resource takes
+// over instead of creating one, e.g. to move hand-made rules under GitOps
+const AdoptAnnotation = "myops.io/id"
+
+// ReadyCondition is true when the gateway object matches the spec
+const ReadyCondition = "Ready"
+
+// SyncStatus is the status shared by all MyOps resources
+type SyncStatus struct {
+	// ID of the gateway object
+	ID string `json:"id,omitempty"`
+	// ObservedGeneration is the generation last applied to the gateway
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastSyncedAt is when the spec was last applied
+	LastSyncedAt *metav1.Time `json:"lastSyncedAt,omitempty"`
+	// Conditions hold the Ready condition
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// SecretKeyRef selects a key of a Secret in the resource's namespace
+type SecretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// MyOpsAlertRuleSpec is a threshold alert rule
+type MyOpsAlertRuleSpec struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Enabled     *bool   `json:"enabled,omitempty"` // true when unset
+	TargetType  string  `json:"targetType"`
+	TargetID    string  `json:"targetId,omitempty"`
+	MetricType  string  `json:"metricType"`
+	Operator    string  `json:"operator"`
+	Threshold   float64 `json:"threshold"`
+	// Duration in seconds the condition must hold
+	Duration      int32  `json:"duration,omitempty"`
+	Severity      string `json:"severity"`
+	NotifyEmail   bool   `json:"notifyEmail,omitempty"`
+	NotifyWebhook bool   `json:"notifyWebhook,omitempty"`
+	WebhookURL    string `json:"webhookUrl,omitempty"`
+}
+
+// MyOpsAlertRule declares an alert rule of the platform
+type MyOpsAlertRule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MyOpsAlertRuleSpec `json:"spec"`
+	Status SyncStatus         `json:"status,omitempty"`
+}
+
+// MyOpsAlertRuleList is a list of MyOpsAlertRule
+type MyOpsAlertRuleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MyOpsAlertRule `json:"items"`
+}
+
+// MyOpsDataSourceSpec is a Prometheus-compatible metrics data source
+type MyOpsDataSourceSpec struct {
+	ClusterID string `json:"clusterId,omitempty"`
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Username  string `json:"username,omitempty"`
+	// PasswordSecretRef holds the password, sent on every sync
+	PasswordSecretRef *SecretKeyRef     `json:"passwordSecretRef,omitempty"`
+	Flavor            string            `json:"flavor,omitempty"`
+	TenantID          string            `json:"tenantId,omitempty"`
+	PartialResponse   bool              `json:"partialResponse,omitempty"`
+	InsecureSkipTLS   bool              `json:"insecureSkipTLS,omitempty"`
+	CACert            string            `json:"caCert,omitempty"`
+	Headers           map[string]string `json:"headers,omitempty"`
+}
+
+// MyOpsDataSource declares a metrics data source of the platform
+type MyOpsDataSource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MyOpsDataSourceSpec `json:"spec"`
+	Status SyncStatus          `json:"status,omitempty"`
+}
+
+// MyOpsDataSourceList is a list of MyOpsDataSource
+type MyOpsDataSourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MyOpsDataSource `json:"items"`
+}
+
+// MyOpsAnomalyRuleSpec is an anomaly detection rule over a PromQL query or a
+// host metric
+type MyOpsAnomalyRuleSpec struct {
+	ClusterID string `json:"clusterId,omitempty"`
+	// DataSourceRef names a MyOpsDataSource in the same namespace; the rule
+	// waits until it is synced
+	DataSourceRef string `json:"dataSourceRef,omitempty"`
+	// DataSourceID is an existing data source not managed by the operator
+	DataSourceID string   `json:"dataSourceId,omitempty"`
+	Name         string   `json:"name"`
+	Description  string   `json:"description,omitempty"`
+	SourceType   string   `json:"sourceType,omitempty"`
+	MetricQuery  string   `json:"metricQuery,omitempty"`
+	HostMetric   string   `json:"hostMetric,omitempty"`
+	HostTags     []string `json:"hostTags,omitempty"`
+	Algorithm    string   `json:"algorithm"`
+	// Sensitivity between 0 and 1
+	Sensitivity float64 `json:"sensitivity,omitempty"`
+	WindowSize  int     `json:"windowSize,omitempty"`
+	Enabled     *bool   `json:"enabled,omitempty"` // true when unset
+	// EvalInterval in seconds
+	EvalInterval int `json:"evalInterval,omitempty"`
+	// AlertThreshold between 0 and 1
+	AlertThreshold  float64 `json:"alertThreshold,omitempty"`
+	AlertOnRecovery bool    `json:"alertOnRecovery,omitempty"`
+}
+
+// MyOpsAnomalyRule declares an anomaly detection rule of the platform
+type MyOpsAnomalyRule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MyOpsAnomalyRuleSpec `json:"spec"`
+	Status SyncStatus           `json:"status,omitempty"`
+}
+
+// MyOpsAnomalyRuleList is a list of MyOpsAnomalyRule
+type MyOpsAnomalyRuleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MyOpsAnomalyRule `json:"items"`
+}
+
+// SyncStatus returns the resource's status, for the shared reconciler
+func (r *MyOpsAlertRule) SyncStatus() *SyncStatus { return &r.Status }
+
+// SyncStatus returns the resource's status, for the shared reconciler
+func (r *MyOpsDataSource) SyncStatus() *SyncStatus { return &r.Status }
+
+// SyncStatus returns the resource's status, for the shared reconciler
+func (r *MyOpsAnomalyRule) SyncStatus() *SyncStatus { return &r.Status }
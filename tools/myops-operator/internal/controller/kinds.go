@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/wangjialin/myops/tools/myops-operator/api/v1alpha1"
+	"github.com/wangjialin/myops/tools/myops-operator/internal/gateway"
+)
+
+// Setup registers the reconcilers of all MyOps resources
+func Setup(mgr ctrl.Manager, gw *gateway.Client, resync time.Duration) error {
+	alertRules := &Reconciler[*v1alpha1.MyOpsAlertRule]{
+		Client:     mgr.GetClient(),
+		Gateway:    gw,
+		Collection: gateway.AlertRules,
+		Resync:     resync,
+		newObject:  func() *v1alpha1.MyOpsAlertRule { return &v1alpha1.MyOpsAlertRule{} },
+		body:       alertRuleBody,
+	}
+	if err := alertRules.SetupWithManager(mgr, "myopsalertrule"); err != nil {
+		return err
+	}
+
+	// Secrets are read directly rather than through the cache, so the operator
+	// does not watch every Secret of the cluster
+	secrets := mgr.GetAPIReader()
+	dataSources := &Reconciler[*v1alpha1.MyOpsDataSource]{
+		Client:     mgr.GetClient(),
+		Gateway:    gw,
+		Collection: gateway.DataSources,
+		Resync:     resync,
+		newObject:  func() *v1alpha1.MyOpsDataSource { return &v1alpha1.MyOpsDataSource{} },
+		body: func(ctx context.Context, ds *v1alpha1.MyOpsDataSource) (interface{}, error) {
+			return dataSourceBody(ctx, secrets, ds)
+		},
+	}
+	if err := dataSources.SetupWithManager(mgr, "myopsdatasource"); err != nil {
+		return err
+	}
+
+	anomalyRules := &Reconciler[*v1alpha1.MyOpsAnomalyRule]{
+		Client:     mgr.GetClient(),
+		Gateway:    gw,
+		Collection: gateway.AnomalyRules,
+		Resync:     resync,
+		newObject:  func() *v1alpha1.MyOpsAnomalyRule { return &v1alpha1.MyOpsAnomalyRule{} },
+	}
+	anomalyRules.body = func(ctx context.Context, rule *v1alpha1.MyOpsAnomalyRule) (interface{}, error) {
+		return anomalyRuleBody(ctx, anomalyRules.Client, rule)
+	}
+	return anomalyRules.SetupWithManager(mgr, "myopsanomalyrule")
+}
+
+func enabled(b *bool) bool {
+	return b == nil || *b
+}
+
+func alertRuleBody(ctx context.Context, rule *v1alpha1.MyOpsAlertRule) (interface{}, error) {
+	spec := rule.Spec
+	return map[string]interface{}{
+		"name":          spec.Name,
+		"description":   spec.Description,
+		"enabled":       enabled(spec.Enabled),
+		"targetType":    spec.TargetType,
+		"targetId":      spec.TargetID,
+		"metricType":    spec.MetricType,
+		"operator":      spec.Operator,
+		"threshold":     spec.Threshold,
+		"duration":      spec.Duration,
+		"severity":      spec.Severity,
+		"notifyEmail":   spec.NotifyEmail,
+		"notifyWebhook": spec.NotifyWebhook,
+		"webhookUrl":    spec.WebhookURL,
+	}, nil
+}
+
+func dataSourceBody(ctx context.Context, secrets client.Reader, ds *v1alpha1.MyOpsDataSource) (interface{}, error) {
+	spec := ds.Spec
+	body := map[string]interface{}{
+		"name":            spec.Name,
+		"url":             spec.URL,
+		"username":        spec.Username,
+		"tenantId":        spec.TenantID,
+		"partialResponse": spec.PartialResponse,
+		"insecureSkipTLS": spec.InsecureSkipTLS,
+		"caCert":          spec.CACert,
+	}
+	if spec.ClusterID != "" {
+		body["clusterId"] = spec.ClusterID
+	}
+	if spec.Flavor != "" {
+		body["flavor"] = spec.Flavor
+	}
+	if len(spec.Headers) > 0 {
+		headers, err := json.Marshal(spec.Headers)
+		if err != nil {
+			return nil, err
+		}
+		body["headers"] = string(headers)
+	}
+
+	if ref := spec.PasswordSecretRef; ref != nil {
+		var secret corev1.Secret
+		if err := secrets.Get(ctx, types.NamespacedName{Namespace: ds.Namespace, Name: ref.Name}, &secret); err != nil {
+			return nil, &waitError{msg: fmt.Sprintf("password secret %s: %v", ref.Name, err)}
+		}
+		password, ok := secret.Data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("password secret %s has no key %s", ref.Name, ref.Key)
+		}
+		body["password"] = string(password)
+	}
+	return body, nil
+}
+
+// anomalyRuleBody builds the rule's request, resolving its data source
+// reference. The cluster, data source and source type of a rule are fixed
+// once it is created.
+func anomalyRuleBody(ctx context.Context, c client.Reader, rule *v1alpha1.MyOpsAnomalyRule) (interface{}, error) {
+	spec := rule.Spec
+	body := map[string]interface{}{
+		"name":            spec.Name,
+		"description":     spec.Description,
+		"metricQuery":     spec.MetricQuery,
+		"hostMetric":      spec.HostMetric,
+		"hostTags":        spec.HostTags,
+		"algorithm":       spec.Algorithm,
+		"enabled":         enabled(spec.Enabled),
+		"alertOnRecovery": spec.AlertOnRecovery,
+	}
+	if spec.HostTags == nil {
+		body["hostTags"] = []string{}
+	}
+	if spec.Sensitivity > 0 {
+		body["sensitivity"] = spec.Sensitivity
+	}
+	if spec.WindowSize > 0 {
+		body["windowSize"] = spec.WindowSize
+	}
+	if spec.EvalInterval > 0 {
+		body["evalInterval"] = spec.EvalInterval
+	}
+	if spec.AlertThreshold > 0 {
+		body["alertThreshold"] = spec.AlertThreshold
+	}
+	if spec.SourceType != "" {
+		body["sourceType"] = spec.SourceType
+	}
+	if spec.ClusterID != "" {
+		body["clusterId"] = spec.ClusterID
+	}
+
+	switch {
+	case spec.DataSourceRef != "" && spec.DataSourceID != "":
+		return nil, fmt.Errorf("only one of dataSourceRef and dataSourceId can be set")
+	case spec.DataSourceRef != "":
+		var ds v1alpha1.MyOpsDataSource
+		if err := c.Get(ctx, types.NamespacedName{Namespace: rule.Namespace, Name: spec.DataSourceRef}, &ds); err != nil {
+			return nil, &waitError{msg: fmt.Sprintf("data source %s: %v", spec.DataSourceRef, err)}
+		}
+		if ds.Status.ID == "" {
+			return nil, &waitError{msg: fmt.Sprintf("data source %s is not synced yet", spec.DataSourceRef)}
+		}
+		body["dataSourceId"] = ds.Status.ID
+	case spec.DataSourceID != "":
+		body["dataSourceId"] = spec.DataSourceID
+	}
+	return body, nil
+}
@@ -0,0 +1,141 @@
+// Package controller reconciles the MyOps resources against the gateway API
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/wangjialin/myops/tools/myops-operator/api/v1alpha1"
+	"github.com/wangjialin/myops/tools/myops-operator/internal/gateway"
+)
+
+// Finalizer holds a resource until its gateway object is deleted
+const Finalizer = "myops.io/gateway-object"
+
+// waitRetry is how soon a resource waiting on another is retried
+const waitRetry = 30 * time.Second
+
+// Object is a MyOps resource
+type Object interface {
+	client.Object
+	SyncStatus() *v1alpha1.SyncStatus
+}
+
+// waitError reports that a resource depends on one not synced yet
+type waitError struct{ msg string }
+
+func (e *waitError) Error() string { return e.msg }
+
+// Reconciler applies one kind of MyOps resource to its gateway collection. The
+// spec is applied on every change and again every Resync, which reverts edits
+// made to the object outside Git.
+type Reconciler[T Object] struct {
+	client.Client
+	Gateway    *gateway.Client
+	Collection string
+	Resync     time.Duration
+
+	newObject func() T
+	// body builds the gateway request for a resource
+	body func(ctx context.Context, obj T) (interface{}, error)
+}
+
+// SetupWithManager registers the reconciler. Status-only changes, including
+// the reconciler's own, are ignored.
+func (r *Reconciler[T]) SetupWithManager(mgr ctrl.Manager, name string) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		For(r.newObject(), builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+// Reconcile creates, updates or deletes the gateway object of a resource
+func (r *Reconciler[T]) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	obj := r.newObject()
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	status := obj.SyncStatus()
+
+	if !obj.GetDeletionTimestamp().IsZero() {
+		if !controllerutil.ContainsFinalizer(obj, Finalizer) {
+			return ctrl.Result{}, nil
+		}
+		if status.ID != "" {
+			if err := r.Gateway.Delete(ctx, r.Collection, status.ID); err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to delete gateway object: %w", err)
+			}
+		}
+		controllerutil.RemoveFinalizer(obj, Finalizer)
+		return ctrl.Result{}, r.Update(ctx, obj)
+	}
+
+	if controllerutil.AddFinalizer(obj, Finalizer) {
+		if err := r.Update(ctx, obj); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	body, err := r.body(ctx, obj)
+	var wait *waitError
+	if errors.As(err, &wait) {
+		return ctrl.Result{RequeueAfter: waitRetry}, r.setReady(ctx, obj, metav1.ConditionFalse, "Waiting", err.Error())
+	}
+	if err != nil {
+		return ctrl.Result{}, errors.Join(err, r.setReady(ctx, obj, metav1.ConditionFalse, "InvalidSpec", err.Error()))
+	}
+
+	id, err := r.apply(ctx, obj, body)
+	if err != nil {
+		return ctrl.Result{}, errors.Join(err, r.setReady(ctx, obj, metav1.ConditionFalse, "SyncFailed", err.Error()))
+	}
+
+	status.ID = id
+	status.ObservedGeneration = obj.GetGeneration()
+	now := metav1.Now()
+	status.LastSyncedAt = &now
+	if err := r.setReady(ctx, obj, metav1.ConditionTrue, "Synced", "Applied to the gateway"); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.FromContext(ctx).V(1).Info("synced", "id", id)
+	return ctrl.Result{RequeueAfter: r.Resync}, nil
+}
+
+// apply updates the resource's gateway object, or the adopted one, and creates
+// it when there is none or it was deleted outside the operator
+func (r *Reconciler[T]) apply(ctx context.Context, obj T, body interface{}) (string, error) {
+	id := obj.SyncStatus().ID
+	if id == "" {
+		id = obj.GetAnnotations()[v1alpha1.AdoptAnnotation]
+	}
+	if id != "" {
+		err := r.Gateway.Update(ctx, r.Collection, id, body)
+		if !errors.Is(err, gateway.ErrNotFound) {
+			return id, err
+		}
+	}
+	return r.Gateway.Create(ctx, r.Collection, body)
+}
+
+// setReady sets the Ready condition and saves the status
+func (r *Reconciler[T]) setReady(ctx context.Context, obj T, status metav1.ConditionStatus, reason, message string) error {
+	apimeta.SetStatusCondition(&obj.SyncStatus().Conditions, metav1.Condition{
+		Type:               v1alpha1.ReadyCondition,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: obj.GetGeneration(),
+	})
+	return r.Status().Update(ctx, obj)
+}
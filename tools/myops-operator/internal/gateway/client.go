@@ -0,0 +1,190 @@
+// Package gateway is the operator's client for the MyOps API gateway
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when the gateway object does not exist
+var ErrNotFound = errors.New("not found")
+
+// Collection paths of the objects managed by the operator
+const (
+	AlertRules   = "/api/v1/alert-rules"
+	DataSources  = "/api/v1/prometheus/datasources"
+	AnomalyRules = "/api/v1/ai/anomaly-rules"
+)
+
+// Client calls the gateway as one user, logging in again when the access
+// token expires
+type Client struct {
+	endpoint string
+	username string
+	password string
+	client   *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+// New creates a client for the gateway at endpoint, authenticating with token
+// or, when empty, with username and password
+func New(endpoint, token, username, password string) (*Client, error) {
+	if token == "" && (username == "" || password == "") {
+		return nil, errors.New("either a token or a username and password is required")
+	}
+	return &Client{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		username: username,
+		password: password,
+		token:    token,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Create creates an object in the collection and returns its ID
+func (c *Client) Create(ctx context.Context, collection string, body interface{}) (string, error) {
+	// Objects come back bare or wrapped in {"data": ...}
+	var resp struct {
+		ID   string `json:"id"`
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodPost, collection, body, &resp); err != nil {
+		return "", err
+	}
+	if resp.ID != "" {
+		return resp.ID, nil
+	}
+	if resp.Data.ID != "" {
+		return resp.Data.ID, nil
+	}
+	return "", fmt.Errorf("POST %s: response has no object ID", collection)
+}
+
+// Update changes an object of the collection
+func (c *Client) Update(ctx context.Context, collection, id string, body interface{}) error {
+	return c.do(ctx, http.MethodPut, collection+"/"+url.PathEscape(id), body, nil)
+}
+
+// Delete deletes an object of the collection. An object already gone is not
+// an error.
+func (c *Client) Delete(ctx context.Context, collection, id string) error {
+	err := c.do(ctx, http.MethodDelete, collection+"/"+url.PathEscape(id), nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// do sends a request, logging in first when there is no token and once more
+// when the token is rejected
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	token, err := c.accessToken(ctx, false)
+	if err != nil {
+		return err
+	}
+	status, err := c.send(ctx, token, method, path, in, out)
+	if status == http.StatusUnauthorized && c.password != "" {
+		if token, err = c.accessToken(ctx, true); err != nil {
+			return err
+		}
+		_, err = c.send(ctx, token, method, path, in, out)
+	}
+	return err
+}
+
+// accessToken returns the current token, logging in when there is none or
+// when renew is set
+func (c *Client) accessToken(ctx context.Context, renew bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && !renew {
+		return c.token, nil
+	}
+
+	var resp struct {
+		Data struct {
+			AccessToken string `json:"accessToken"`
+			MFARequired bool   `json:"mfaRequired"`
+		} `json:"data"`
+	}
+	body := map[string]string{"username": c.username, "password": c.password}
+	if _, err := c.send(ctx, "", http.MethodPost, "/api/v1/auth/login", body, &resp); err != nil {
+		return "", fmt.Errorf("failed to log in: %w", err)
+	}
+	if resp.Data.MFARequired {
+		return "", errors.New("the user requires MFA to log in; use a token instead")
+	}
+	c.token = resp.Data.AccessToken
+	return c.token, nil
+}
+
+// send sends one request and returns the response status
+func (c *Client) send(ctx context.Context, token, method, path string, in, out interface{}) (int, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	req.Header.Set("User-Agent", "myops-operator/1.0")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return resp.StatusCode, ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, fmt.Errorf("%s %s: server returned status %d: %s", method, path, resp.StatusCode, errorMessage(data))
+	}
+	if out == nil {
+		return resp.StatusCode, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// errorMessage extracts the message of a gateway error response
+func errorMessage(body []byte) string {
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &resp) == nil && resp.Error.Message != "" {
+		return resp.Error.Message
+	}
+	return strings.TrimSpace(string(body))
+}
@@ -0,0 +1,93 @@
+// Command myops-operator reconciles MyOps custom resources in a management
+// cluster against the gateway API, so platform configuration can be managed
+// with GitOps tools like Argo CD or Flux
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"github.com/wangjialin/myops/tools/myops-operator/api/v1alpha1"
+	"github.com/wangjialin/myops/tools/myops-operator/internal/controller"
+	"github.com/wangjialin/myops/tools/myops-operator/internal/gateway"
+)
+
+func main() {
+	var (
+		metricsAddr    string
+		probeAddr      string
+		leaderElection bool
+		resync         time.Duration
+	)
+	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "Address of the metrics endpoint")
+	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "Address of the health probes")
+	flag.BoolVar(&leaderElection, "leader-elect", false, "Elect a leader so that only one replica reconciles")
+	flag.DurationVar(&resync, "resync", 10*time.Minute, "How often resources are applied again, reverting changes made outside Git")
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	logger := ctrl.Log.WithName("setup")
+
+	// Gateway credentials come from the environment, typically a Secret
+	endpoint := os.Getenv("MYOPS_ENDPOINT")
+	if endpoint == "" {
+		logger.Error(nil, "MYOPS_ENDPOINT is required")
+		os.Exit(1)
+	}
+	gw, err := gateway.New(endpoint, os.Getenv("MYOPS_TOKEN"), os.Getenv("MYOPS_USERNAME"), os.Getenv("MYOPS_PASSWORD"))
+	if err != nil {
+		logger.Error(err, "invalid gateway credentials")
+		os.Exit(1)
+	}
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		logger.Error(err, "failed to register Kubernetes types")
+		os.Exit(1)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		logger.Error(err, "failed to register MyOps types")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
+		HealthProbeBindAddress: probeAddr,
+		LeaderElection:         leaderElection,
+		LeaderElectionID:       "myops-operator.myops.io",
+	})
+	if err != nil {
+		logger.Error(err, "failed to create manager")
+		os.Exit(1)
+	}
+
+	if err := controller.Setup(mgr, gw, resync); err != nil {
+		logger.Error(err, "failed to set up controllers")
+		os.Exit(1)
+	}
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		logger.Error(err, "failed to set up health check")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+		logger.Error(err, "failed to set up ready check")
+		os.Exit(1)
+	}
+
+	logger.Info("starting manager")
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		logger.Error(err, "manager stopped")
+		os.Exit(1)
+	}
+}
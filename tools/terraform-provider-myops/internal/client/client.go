@@ -0,0 +1,130 @@
+// Package client is a small Go client for the parts of the MyOps API managed by
+// the Terraform provider
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the requested object does not exist
+var ErrNotFound = errors.New("not found")
+
+// Client calls the MyOps API gateway as one user
+type Client struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+// New creates a client for the API gateway at endpoint. With an empty token,
+// the client logs in with username and password.
+func New(endpoint, token, username, password string) (*Client, error) {
+	c := &Client{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		token:    token,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if c.token == "" {
+		if err := c.login(username, password); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// login exchanges the user's credentials for an access token
+func (c *Client) login(username, password string) error {
+	if username == "" || password == "" {
+		return errors.New("either a token or a username and password is required")
+	}
+
+	var resp struct {
+		Data struct {
+			AccessToken string `json:"accessToken"`
+			MFARequired bool   `json:"mfaRequired"`
+		} `json:"data"`
+	}
+	body := map[string]string{"username": username, "password": password}
+	if err := c.do(http.MethodPost, "/api/v1/auth/login", body, &resp); err != nil {
+		return fmt.Errorf("failed to log in: %w", err)
+	}
+	if resp.Data.MFARequired {
+		return errors.New("the user requires MFA to log in; use a token instead")
+	}
+	c.token = resp.Data.AccessToken
+	return nil
+}
+
+// do sends a request with a JSON body, when given, and decodes the response
+// into out, when given
+func (c *Client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.endpoint+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
+	}
+	req.Header.Set("User-Agent", "terraform-provider-myops/1.0")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s: server returned status %d: %s", method, path, resp.StatusCode, errorMessage(data))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// errorMessage extracts the message of an error response. The gateway answers
+// {"error":{"code","message"}}, the RBAC endpoints {"error":"message"}.
+func errorMessage(body []byte) string {
+	var structured struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &structured) == nil && structured.Error.Message != "" {
+		return structured.Error.Message
+	}
+	var plain struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &plain) == nil && plain.Error != "" {
+		return plain.Error
+	}
+	return strings.TrimSpace(string(body))
+}
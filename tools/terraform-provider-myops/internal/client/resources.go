@@ -0,0 +1,346 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Cluster is a Kubernetes cluster registered with the platform
+type Cluster struct {
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type,omitempty"`
+	Endpoint    string `json:"endpoint"`
+	Kubeconfig  string `json:"kubeconfig,omitempty"` // write-only, never returned
+	Region      string `json:"region,omitempty"`
+	Provider    string `json:"provider,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Version     string `json:"version,omitempty"`
+}
+
+// CreateCluster registers a cluster
+func (c *Client) CreateCluster(cluster *Cluster) (*Cluster, error) {
+	var resp struct {
+		Data Cluster `json:"data"`
+	}
+	if err := c.do(http.MethodPost, "/api/v1/clusters", cluster, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+// GetCluster gets a cluster
+func (c *Client) GetCluster(id string) (*Cluster, error) {
+	var resp struct {
+		Data Cluster `json:"data"`
+	}
+	if err := c.do(http.MethodGet, "/api/v1/clusters/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+// UpdateCluster changes a cluster's name, description, endpoint and, when
+// set, kubeconfig
+func (c *Client) UpdateCluster(id string, cluster *Cluster) (*Cluster, error) {
+	body := map[string]string{
+		"name":        cluster.Name,
+		"description": cluster.Description,
+		"endpoint":    cluster.Endpoint,
+		"kubeconfig":  cluster.Kubeconfig,
+	}
+	var resp struct {
+		Data Cluster `json:"data"`
+	}
+	if err := c.do(http.MethodPut, "/api/v1/clusters/"+url.PathEscape(id), body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+// DeleteCluster unregisters a cluster
+func (c *Client) DeleteCluster(id string) error {
+	return c.do(http.MethodDelete, "/api/v1/clusters/"+url.PathEscape(id), nil, nil)
+}
+
+// DataSource is a Prometheus-compatible metrics data source
+type DataSource struct {
+	ID              string  `json:"id,omitempty"`
+	ClusterID       *string `json:"clusterId,omitempty"`
+	Name            string  `json:"name"`
+	URL             string  `json:"url"`
+	Username        string  `json:"username"`
+	Password        string  `json:"password,omitempty"`  // write-only, never returned
+	ClientKey       string  `json:"clientKey,omitempty"` // write-only, never returned
+	Flavor          string  `json:"flavor,omitempty"`
+	TenantID        string  `json:"tenantId"`
+	PartialResponse bool    `json:"partialResponse"`
+	InsecureSkipTLS bool    `json:"insecureSkipTLS"`
+	CACert          string  `json:"caCert"`
+	ClientCert      string  `json:"clientCert"`
+	Headers         string  `json:"headers"` // JSON object of header -> value
+	Status          string  `json:"status,omitempty"`
+}
+
+// CreateDataSource adds a data source
+func (c *Client) CreateDataSource(ds *DataSource) (*DataSource, error) {
+	var resp DataSource
+	if err := c.do(http.MethodPost, "/api/v1/prometheus/datasources", ds, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetDataSource gets a data source
+func (c *Client) GetDataSource(id string) (*DataSource, error) {
+	var resp DataSource
+	if err := c.do(http.MethodGet, "/api/v1/prometheus/datasources/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UpdateDataSource changes a data source. The password and client key are only
+// changed when set.
+func (c *Client) UpdateDataSource(id string, ds *DataSource) (*DataSource, error) {
+	body := map[string]interface{}{
+		"name":            ds.Name,
+		"url":             ds.URL,
+		"username":        ds.Username,
+		"flavor":          ds.Flavor,
+		"tenantId":        ds.TenantID,
+		"partialResponse": ds.PartialResponse,
+		"insecureSkipTLS": ds.InsecureSkipTLS,
+		"caCert":          ds.CACert,
+		"clientCert":      ds.ClientCert,
+		"headers":         ds.Headers,
+	}
+	if ds.Password != "" {
+		body["password"] = ds.Password
+	}
+	if ds.ClientKey != "" {
+		body["clientKey"] = ds.ClientKey
+	}
+	var resp DataSource
+	if err := c.do(http.MethodPut, "/api/v1/prometheus/datasources/"+url.PathEscape(id), body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteDataSource removes a data source
+func (c *Client) DeleteDataSource(id string) error {
+	return c.do(http.MethodDelete, "/api/v1/prometheus/datasources/"+url.PathEscape(id), nil, nil)
+}
+
+// AlertRule is a threshold rule evaluated by the alert engine
+type AlertRule struct {
+	ID            string  `json:"id,omitempty"`
+	Name          string  `json:"name"`
+	Description   string  `json:"description"`
+	Enabled       bool    `json:"enabled"`
+	TargetType    string  `json:"targetType"`
+	TargetID      string  `json:"targetId"`
+	MetricType    string  `json:"metricType"`
+	Operator      string  `json:"operator"`
+	Threshold     float64 `json:"threshold"`
+	Duration      int32   `json:"duration"`
+	Severity      string  `json:"severity"`
+	NotifyEmail   bool    `json:"notifyEmail"`
+	NotifyWebhook bool    `json:"notifyWebhook"`
+	WebhookURL    string  `json:"webhookUrl"`
+}
+
+// CreateAlertRule creates an alert rule
+func (c *Client) CreateAlertRule(rule *AlertRule) (*AlertRule, error) {
+	var resp struct {
+		Data AlertRule `json:"data"`
+	}
+	if err := c.do(http.MethodPost, "/api/v1/alert-rules", rule, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+// GetAlertRule gets an alert rule
+func (c *Client) GetAlertRule(id string) (*AlertRule, error) {
+	var resp struct {
+		Data AlertRule `json:"data"`
+	}
+	if err := c.do(http.MethodGet, "/api/v1/alert-rules/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+// UpdateAlertRule replaces an alert rule
+func (c *Client) UpdateAlertRule(id string, rule *AlertRule) (*AlertRule, error) {
+	var resp struct {
+		Data AlertRule `json:"data"`
+	}
+	if err := c.do(http.MethodPut, "/api/v1/alert-rules/"+url.PathEscape(id), rule, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+// DeleteAlertRule deletes an alert rule
+func (c *Client) DeleteAlertRule(id string) error {
+	return c.do(http.MethodDelete, "/api/v1/alert-rules/"+url.PathEscape(id), nil, nil)
+}
+
+// Role is an RBAC role
+type Role struct {
+	ID          string  `json:"id,omitempty"`
+	Name        string  `json:"name"`
+	DisplayName string  `json:"displayName"`
+	Description string  `json:"description"`
+	IsDefault   bool    `json:"isDefault"`
+	IsSystem    bool    `json:"isSystem,omitempty"`
+	ParentID    *string `json:"parentId,omitempty"`
+}
+
+// CreateRole creates a role without permissions
+func (c *Client) CreateRole(role *Role) (*Role, error) {
+	var resp Role
+	if err := c.do(http.MethodPost, "/api/v1/rbac/roles", role, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetRole gets a role
+func (c *Client) GetRole(id string) (*Role, error) {
+	var resp struct {
+		Role Role `json:"role"`
+	}
+	if err := c.do(http.MethodGet, "/api/v1/rbac/roles/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Role, nil
+}
+
+// UpdateRole changes a role's display name, description and default flag
+func (c *Client) UpdateRole(id string, role *Role) (*Role, error) {
+	body := map[string]interface{}{
+		"displayName": role.DisplayName,
+		"description": role.Description,
+		"isDefault":   role.IsDefault,
+	}
+	var resp Role
+	if err := c.do(http.MethodPut, "/api/v1/rbac/roles/"+url.PathEscape(id), body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteRole deletes a role
+func (c *Client) DeleteRole(id string) error {
+	return c.do(http.MethodDelete, "/api/v1/rbac/roles/"+url.PathEscape(id), nil, nil)
+}
+
+// RolePermissionIDs lists the IDs of the permissions granted to a role
+func (c *Client) RolePermissionIDs(id string) ([]string, error) {
+	var resp struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := c.do(http.MethodGet, "/api/v1/rbac/roles/"+url.PathEscape(id)+"/permissions", nil, &resp); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(resp.Data))
+	for _, p := range resp.Data {
+		ids = append(ids, p.ID)
+	}
+	return ids, nil
+}
+
+// SetRolePermissions replaces the permissions granted to a role
+func (c *Client) SetRolePermissions(id string, permissionIDs []string) error {
+	if len(permissionIDs) > 0 {
+		body := map[string]interface{}{"permissionIds": permissionIDs, "override": true}
+		return c.do(http.MethodPost, "/api/v1/rbac/roles/"+url.PathEscape(id)+"/permissions", body, nil)
+	}
+
+	// An override needs at least one permission, so an empty set is reached
+	// by removing the current ones
+	current, err := c.RolePermissionIDs(id)
+	if err != nil {
+		return err
+	}
+	for _, pid := range current {
+		path := fmt.Sprintf("/api/v1/rbac/roles/%s/permissions/%s", url.PathEscape(id), url.PathEscape(pid))
+		if err := c.do(http.MethodDelete, path, nil, nil); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// WebhookEndpoint is a notification channel receiving signed event deliveries
+type WebhookEndpoint struct {
+	ID          string              `json:"id,omitempty"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	URL         string              `json:"url"`
+	Secret      string              `json:"secret,omitempty"` // only returned on creation
+	Events      []string            `json:"events"`
+	Filters     map[string][]string `json:"filters"`
+	MaxAttempts int                 `json:"maxAttempts,omitempty"`
+	Enabled     *bool               `json:"enabled,omitempty"`
+}
+
+// CreateWebhookEndpoint creates a webhook endpoint. The signing secret is
+// generated by the server when not set, and returned only here.
+func (c *Client) CreateWebhookEndpoint(endpoint *WebhookEndpoint) (*WebhookEndpoint, error) {
+	var resp struct {
+		Endpoint WebhookEndpoint `json:"endpoint"`
+		Secret   string          `json:"secret"`
+	}
+	if err := c.do(http.MethodPost, "/api/v1/webhooks/endpoints", endpoint, &resp); err != nil {
+		return nil, err
+	}
+	resp.Endpoint.Secret = resp.Secret
+	return &resp.Endpoint, nil
+}
+
+// GetWebhookEndpoint gets a webhook endpoint
+func (c *Client) GetWebhookEndpoint(id string) (*WebhookEndpoint, error) {
+	var resp WebhookEndpoint
+	if err := c.do(http.MethodGet, "/api/v1/webhooks/endpoints/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UpdateWebhookEndpoint changes a webhook endpoint. The secret is only changed
+// when set.
+func (c *Client) UpdateWebhookEndpoint(id string, endpoint *WebhookEndpoint) (*WebhookEndpoint, error) {
+	body := map[string]interface{}{
+		"name":        endpoint.Name,
+		"description": endpoint.Description,
+		"url":         endpoint.URL,
+		"events":      endpoint.Events,
+		"filters":     endpoint.Filters,
+		"enabled":     endpoint.Enabled,
+	}
+	if endpoint.Secret != "" {
+		body["secret"] = endpoint.Secret
+	}
+	if endpoint.MaxAttempts > 0 {
+		body["maxAttempts"] = endpoint.MaxAttempts
+	}
+	var resp WebhookEndpoint
+	if err := c.do(http.MethodPut, "/api/v1/webhooks/endpoints/"+url.PathEscape(id), body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteWebhookEndpoint deletes a webhook endpoint
+func (c *Client) DeleteWebhookEndpoint(id string) error {
+	return c.do(http.MethodDelete, "/api/v1/webhooks/endpoints/"+url.PathEscape(id), nil, nil)
+}
@@ -0,0 +1,122 @@
+// Package provider implements the MyOps Terraform provider
+package provider
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/wangjialin/myops/tools/terraform-provider-myops/internal/client"
+)
+
+// New returns the provider
+func New() *schema.Provider {
+	return &schema.Provider{
+		Schema: map[string]*schema.Schema{
+			"endpoint": {
+				Type:        schema.TypeString,
+				Required:    true,
+				DefaultFunc: schema.EnvDefaultFunc("MYOPS_ENDPOINT", nil),
+				Description: "API gateway URL, e.g. https://myops.example.com. Defaults to MYOPS_ENDPOINT.",
+			},
+			"token": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("MYOPS_TOKEN", ""),
+				Description: "Access token. Defaults to MYOPS_TOKEN; when empty, the provider logs in with username and password.",
+			},
+			"username": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("MYOPS_USERNAME", ""),
+				Description: "User to log in as. Defaults to MYOPS_USERNAME.",
+			},
+			"password": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("MYOPS_PASSWORD", ""),
+				Description: "Password of the user. Defaults to MYOPS_PASSWORD.",
+			},
+		},
+		ResourcesMap: map[string]*schema.Resource{
+			"myops_cluster":                resourceCluster(),
+			"myops_prometheus_data_source": resourcePrometheusDataSource(),
+			"myops_alert_rule":             resourceAlertRule(),
+			"myops_role":                   resourceRole(),
+			"myops_notification_channel":   resourceNotificationChannel(),
+		},
+		ConfigureContextFunc: configure,
+	}
+}
+
+func configure(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+	c, err := client.New(d.Get("endpoint").(string), d.Get("token").(string), d.Get("username").(string), d.Get("password").(string))
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
+	return c, nil
+}
+
+// readResult handles the error of a read: an object deleted outside Terraform
+// is dropped from the state so that the next plan recreates it
+func readResult(d *schema.ResourceData, err error) diag.Diagnostics {
+	if errors.Is(err, client.ErrNotFound) {
+		d.SetId("")
+		return nil
+	}
+	return diag.FromErr(err)
+}
+
+// deleteResult handles the error of a delete: an object already gone is deleted
+func deleteResult(err error) diag.Diagnostics {
+	if err == nil || errors.Is(err, client.ErrNotFound) {
+		return nil
+	}
+	return diag.FromErr(err)
+}
+
+// setAll sets state attributes, stopping at the first error
+func setAll(d *schema.ResourceData, values map[string]interface{}) diag.Diagnostics {
+	for key, value := range values {
+		if err := d.Set(key, value); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	return nil
+}
+
+// optionalID returns a pointer to an optional ID attribute, nil when unset
+func optionalID(d *schema.ResourceData, key string) *string {
+	if v := d.Get(key).(string); v != "" {
+		return &v
+	}
+	return nil
+}
+
+// stringOrEmpty dereferences an optional ID
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// splitValues splits a comma-separated list, dropping empty values
+func splitValues(s string) []string {
+	values := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// joinValues is the inverse of splitValues
+func joinValues(values []string) string {
+	return strings.Join(values, ",")
+}
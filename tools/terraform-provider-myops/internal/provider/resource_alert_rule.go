@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/wangjialin/myops/tools/terraform-provider-myops/internal/client"
+)
+
+func resourceAlertRule() *schema.Resource {
+	return &schema.Resource{
+		Description:   "A threshold alert rule evaluated by the alert engine.",
+		CreateContext: resourceAlertRuleCreate,
+		ReadContext:   resourceAlertRuleRead,
+		UpdateContext: resourceAlertRuleUpdate,
+		DeleteContext: resourceAlertRuleDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"enabled": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"target_type": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.StringInSlice([]string{"host", "cluster", "node", "pod"}, false),
+			},
+			"target_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Target to evaluate; all targets of the type when empty.",
+			},
+			"metric_type": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "e.g. cpu_usage, memory_usage, disk_usage, host_heartbeat_age, pod_status or node_status.",
+			},
+			"operator": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.StringInSlice([]string{">", "<", ">=", "<=", "==", "!="}, false),
+			},
+			"threshold": {
+				Type:     schema.TypeFloat,
+				Required: true,
+			},
+			"duration": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     300,
+				Description: "Seconds the condition must hold before the alert fires.",
+			},
+			"severity": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.StringInSlice([]string{"critical", "warning", "info"}, false),
+			},
+			"notify_email": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"notify_webhook": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"webhook_url": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+		},
+	}
+}
+
+func alertRuleFromData(d *schema.ResourceData) *client.AlertRule {
+	return &client.AlertRule{
+		Name:          d.Get("name").(string),
+		Description:   d.Get("description").(string),
+		Enabled:       d.Get("enabled").(bool),
+		TargetType:    d.Get("target_type").(string),
+		TargetID:      d.Get("target_id").(string),
+		MetricType:    d.Get("metric_type").(string),
+		Operator:      d.Get("operator").(string),
+		Threshold:     d.Get("threshold").(float64),
+		Duration:      int32(d.Get("duration").(int)),
+		Severity:      d.Get("severity").(string),
+		NotifyEmail:   d.Get("notify_email").(bool),
+		NotifyWebhook: d.Get("notify_webhook").(bool),
+		WebhookURL:    d.Get("webhook_url").(string),
+	}
+}
+
+func resourceAlertRuleCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	created, err := meta.(*client.Client).CreateAlertRule(alertRuleFromData(d))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(created.ID)
+	return resourceAlertRuleRead(ctx, d, meta)
+}
+
+func resourceAlertRuleRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	rule, err := meta.(*client.Client).GetAlertRule(d.Id())
+	if err != nil {
+		return readResult(d, err)
+	}
+	return setAll(d, map[string]interface{}{
+		"name":           rule.Name,
+		"description":    rule.Description,
+		"enabled":        rule.Enabled,
+		"target_type":    rule.TargetType,
+		"target_id":      rule.TargetID,
+		"metric_type":    rule.MetricType,
+		"operator":       rule.Operator,
+		"threshold":      rule.Threshold,
+		"duration":       int(rule.Duration),
+		"severity":       rule.Severity,
+		"notify_email":   rule.NotifyEmail,
+		"notify_webhook": rule.NotifyWebhook,
+		"webhook_url":    rule.WebhookURL,
+	})
+}
+
+func resourceAlertRuleUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	if _, err := meta.(*client.Client).UpdateAlertRule(d.Id(), alertRuleFromData(d)); err != nil {
+		return diag.FromErr(err)
+	}
+	return resourceAlertRuleRead(ctx, d, meta)
+}
+
+func resourceAlertRuleDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return deleteResult(meta.(*client.Client).DeleteAlertRule(d.Id()))
+}
@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/wangjialin/myops/tools/terraform-provider-myops/internal/client"
+)
+
+func resourceCluster() *schema.Resource {
+	return &schema.Resource{
+		Description:   "A Kubernetes cluster registered with the platform. The kubeconfig is never read back, so imported clusters keep their kubeconfig until it is set.",
+		CreateContext: resourceClusterCreate,
+		ReadContext:   resourceClusterRead,
+		UpdateContext: resourceClusterUpdate,
+		DeleteContext: resourceClusterDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"type": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringInSlice([]string{"managed", "self-hosted"}, false),
+			},
+			"endpoint": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"kubeconfig": {
+				Type:      schema.TypeString,
+				Optional:  true,
+				Sensitive: true,
+			},
+			"region": {
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+			"provider_name": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Cloud provider, e.g. aws, gcp or azure.",
+			},
+			"status": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"version": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func clusterFromData(d *schema.ResourceData) *client.Cluster {
+	return &client.Cluster{
+		Name:        d.Get("name").(string),
+		Description: d.Get("description").(string),
+		Type:        d.Get("type").(string),
+		Endpoint:    d.Get("endpoint").(string),
+		Kubeconfig:  d.Get("kubeconfig").(string),
+		Region:      d.Get("region").(string),
+		Provider:    d.Get("provider_name").(string),
+	}
+}
+
+func resourceClusterCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*client.Client)
+	cluster := clusterFromData(d)
+	if cluster.Kubeconfig == "" {
+		return diag.Errorf("kubeconfig is required to register a cluster")
+	}
+
+	created, err := c.CreateCluster(cluster)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(created.ID)
+	return resourceClusterRead(ctx, d, meta)
+}
+
+func resourceClusterRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	cluster, err := meta.(*client.Client).GetCluster(d.Id())
+	if err != nil {
+		return readResult(d, err)
+	}
+	return setAll(d, map[string]interface{}{
+		"name":          cluster.Name,
+		"description":   cluster.Description,
+		"type":          cluster.Type,
+		"endpoint":      cluster.Endpoint,
+		"region":        cluster.Region,
+		"provider_name": cluster.Provider,
+		"status":        cluster.Status,
+		"version":       cluster.Version,
+	})
+}
+
+func resourceClusterUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	cluster := clusterFromData(d)
+	if !d.HasChange("kubeconfig") {
+		cluster.Kubeconfig = ""
+	}
+	if _, err := meta.(*client.Client).UpdateCluster(d.Id(), cluster); err != nil {
+		return diag.FromErr(err)
+	}
+	return resourceClusterRead(ctx, d, meta)
+}
+
+func resourceClusterDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return deleteResult(meta.(*client.Client).DeleteCluster(d.Id()))
+}
@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/wangjialin/myops/tools/terraform-provider-myops/internal/client"
+)
+
+func resourceNotificationChannel() *schema.Resource {
+	return &schema.Resource{
+		Description:   "A webhook notification channel receiving signed deliveries of platform events.",
+		CreateContext: resourceNotificationChannelCreate,
+		ReadContext:   resourceNotificationChannelRead,
+		UpdateContext: resourceNotificationChannelUpdate,
+		DeleteContext: resourceNotificationChannelDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"url": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.IsURLWithHTTPorHTTPS,
+			},
+			"events": {
+				Type:        schema.TypeSet,
+				Required:    true,
+				MinItems:    1,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Event types delivered, e.g. alert.fired; see GET /api/v1/webhooks/events.",
+			},
+			"filters": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Event attribute -> comma-separated allowed values.",
+			},
+			"max_attempts": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				Computed: true,
+			},
+			"enabled": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"secret": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "HMAC-SHA256 signing key. Generated when not set; unknown for imported channels.",
+			},
+		},
+	}
+}
+
+func notificationChannelFromData(d *schema.ResourceData) *client.WebhookEndpoint {
+	events := []string{}
+	for _, e := range d.Get("events").(*schema.Set).List() {
+		events = append(events, e.(string))
+	}
+	filters := map[string][]string{}
+	for attr, values := range d.Get("filters").(map[string]interface{}) {
+		filters[attr] = splitValues(values.(string))
+	}
+	enabled := d.Get("enabled").(bool)
+	return &client.WebhookEndpoint{
+		Name:        d.Get("name").(string),
+		Description: d.Get("description").(string),
+		URL:         d.Get("url").(string),
+		Secret:      d.Get("secret").(string),
+		Events:      events,
+		Filters:     filters,
+		MaxAttempts: d.Get("max_attempts").(int),
+		Enabled:     &enabled,
+	}
+}
+
+func resourceNotificationChannelCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	created, err := meta.(*client.Client).CreateWebhookEndpoint(notificationChannelFromData(d))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(created.ID)
+	if err := d.Set("secret", created.Secret); err != nil {
+		return diag.FromErr(err)
+	}
+	return resourceNotificationChannelRead(ctx, d, meta)
+}
+
+func resourceNotificationChannelRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	endpoint, err := meta.(*client.Client).GetWebhookEndpoint(d.Id())
+	if err != nil {
+		return readResult(d, err)
+	}
+	filters := map[string]string{}
+	for attr, values := range endpoint.Filters {
+		filters[attr] = joinValues(values)
+	}
+	enabled := endpoint.Enabled != nil && *endpoint.Enabled
+	return setAll(d, map[string]interface{}{
+		"name":         endpoint.Name,
+		"description":  endpoint.Description,
+		"url":          endpoint.URL,
+		"events":       endpoint.Events,
+		"filters":      filters,
+		"max_attempts": endpoint.MaxAttempts,
+		"enabled":      enabled,
+	})
+}
+
+func resourceNotificationChannelUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	endpoint := notificationChannelFromData(d)
+	if !d.HasChange("secret") {
+		endpoint.Secret = ""
+	}
+	if _, err := meta.(*client.Client).UpdateWebhookEndpoint(d.Id(), endpoint); err != nil {
+		return diag.FromErr(err)
+	}
+	return resourceNotificationChannelRead(ctx, d, meta)
+}
+
+func resourceNotificationChannelDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return deleteResult(meta.(*client.Client).DeleteWebhookEndpoint(d.Id()))
+}
@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/structure"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/wangjialin/myops/tools/terraform-provider-myops/internal/client"
+)
+
+func resourcePrometheusDataSource() *schema.Resource {
+	return &schema.Resource{
+		Description:   "A Prometheus-compatible metrics data source. The password and client key are never read back.",
+		CreateContext: resourcePrometheusDataSourceCreate,
+		ReadContext:   resourcePrometheusDataSourceRead,
+		UpdateContext: resourcePrometheusDataSourceUpdate,
+		DeleteContext: resourcePrometheusDataSourceDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"cluster_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"url": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"username": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"password": {
+				Type:      schema.TypeString,
+				Optional:  true,
+				Sensitive: true,
+			},
+			"flavor": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "prometheus",
+				ValidateFunc: validation.StringInSlice([]string{"prometheus", "thanos", "victoriametrics", "mimir"}, false),
+			},
+			"tenant_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"partial_response": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"insecure_skip_tls": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"ca_cert": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"client_cert": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"client_key": {
+				Type:      schema.TypeString,
+				Optional:  true,
+				Sensitive: true,
+			},
+			"headers": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "JSON object of extra request headers.",
+				ValidateFunc:     validation.StringIsJSON,
+				DiffSuppressFunc: structure.SuppressJsonDiff,
+			},
+			"status": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func dataSourceFromData(d *schema.ResourceData) *client.DataSource {
+	return &client.DataSource{
+		ClusterID:       optionalID(d, "cluster_id"),
+		Name:            d.Get("name").(string),
+		URL:             d.Get("url").(string),
+		Username:        d.Get("username").(string),
+		Password:        d.Get("password").(string),
+		Flavor:          d.Get("flavor").(string),
+		TenantID:        d.Get("tenant_id").(string),
+		PartialResponse: d.Get("partial_response").(bool),
+		InsecureSkipTLS: d.Get("insecure_skip_tls").(bool),
+		CACert:          d.Get("ca_cert").(string),
+		ClientCert:      d.Get("client_cert").(string),
+		ClientKey:       d.Get("client_key").(string),
+		Headers:         d.Get("headers").(string),
+	}
+}
+
+func resourcePrometheusDataSourceCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	created, err := meta.(*client.Client).CreateDataSource(dataSourceFromData(d))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(created.ID)
+	return resourcePrometheusDataSourceRead(ctx, d, meta)
+}
+
+func resourcePrometheusDataSourceRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	ds, err := meta.(*client.Client).GetDataSource(d.Id())
+	if err != nil {
+		return readResult(d, err)
+	}
+	return setAll(d, map[string]interface{}{
+		"cluster_id":        stringOrEmpty(ds.ClusterID),
+		"name":              ds.Name,
+		"url":               ds.URL,
+		"username":          ds.Username,
+		"flavor":            ds.Flavor,
+		"tenant_id":         ds.TenantID,
+		"partial_response":  ds.PartialResponse,
+		"insecure_skip_tls": ds.InsecureSkipTLS,
+		"ca_cert":           ds.CACert,
+		"client_cert":       ds.ClientCert,
+		"headers":           ds.Headers,
+		"status":            ds.Status,
+	})
+}
+
+func resourcePrometheusDataSourceUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	ds := dataSourceFromData(d)
+	if !d.HasChange("password") {
+		ds.Password = ""
+	}
+	if !d.HasChange("client_key") {
+		ds.ClientKey = ""
+	}
+	if _, err := meta.(*client.Client).UpdateDataSource(d.Id(), ds); err != nil {
+		return diag.FromErr(err)
+	}
+	return resourcePrometheusDataSourceRead(ctx, d, meta)
+}
+
+func resourcePrometheusDataSourceDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return deleteResult(meta.(*client.Client).DeleteDataSource(d.Id()))
+}
@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/wangjialin/myops/tools/terraform-provider-myops/internal/client"
+)
+
+func resourceRole() *schema.Resource {
+	return &schema.Resource{
+		Description:   "An RBAC role and the permissions it grants. System roles can be imported but not changed.",
+		CreateContext: resourceRoleCreate,
+		ReadContext:   resourceRoleRead,
+		UpdateContext: resourceRoleUpdate,
+		DeleteContext: resourceRoleDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"display_name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"is_default": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Whether new users get the role.",
+			},
+			"parent_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Role whose permissions this role inherits.",
+			},
+			"permission_ids": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"is_system": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func roleFromData(d *schema.ResourceData) *client.Role {
+	return &client.Role{
+		Name:        d.Get("name").(string),
+		DisplayName: d.Get("display_name").(string),
+		Description: d.Get("description").(string),
+		IsDefault:   d.Get("is_default").(bool),
+		ParentID:    optionalID(d, "parent_id"),
+	}
+}
+
+func permissionIDsFromData(d *schema.ResourceData) []string {
+	set := d.Get("permission_ids").(*schema.Set).List()
+	ids := make([]string, 0, len(set))
+	for _, id := range set {
+		ids = append(ids, id.(string))
+	}
+	return ids
+}
+
+func resourceRoleCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*client.Client)
+	created, err := c.CreateRole(roleFromData(d))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(created.ID)
+
+	if ids := permissionIDsFromData(d); len(ids) > 0 {
+		if err := c.SetRolePermissions(d.Id(), ids); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	return resourceRoleRead(ctx, d, meta)
+}
+
+func resourceRoleRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*client.Client)
+	role, err := c.GetRole(d.Id())
+	if err != nil {
+		return readResult(d, err)
+	}
+	permissionIDs, err := c.RolePermissionIDs(d.Id())
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	return setAll(d, map[string]interface{}{
+		"name":           role.Name,
+		"display_name":   role.DisplayName,
+		"description":    role.Description,
+		"is_default":     role.IsDefault,
+		"parent_id":      stringOrEmpty(role.ParentID),
+		"permission_ids": permissionIDs,
+		"is_system":      role.IsSystem,
+	})
+}
+
+func resourceRoleUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*client.Client)
+	if d.HasChanges("display_name", "description", "is_default") {
+		if _, err := c.UpdateRole(d.Id(), roleFromData(d)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	if d.HasChange("permission_ids") {
+		if err := c.SetRolePermissions(d.Id(), permissionIDsFromData(d)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	return resourceRoleRead(ctx, d, meta)
+}
+
+func resourceRoleDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return deleteResult(meta.(*client.Client).DeleteRole(d.Id()))
+}
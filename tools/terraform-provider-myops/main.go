@@ -0,0 +1,21 @@
+// Command terraform-provider-myops is the MyOps Terraform provider, managing
+// clusters, data sources, alert rules, roles and notification channels as code
+package main
+
+import (
+	"flag"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
+	"github.com/wangjialin/myops/tools/terraform-provider-myops/internal/provider"
+)
+
+func main() {
+	debug := flag.Bool("debug", false, "Run the provider with support for debuggers like delve")
+	flag.Parse()
+
+	plugin.Serve(&plugin.ServeOpts{
+		ProviderFunc: provider.New,
+		ProviderAddr: "registry.terraform.io/wangjialin/myops",
+		Debug:        *debug,
+	})
+}